@@ -33,3 +33,16 @@ type BPFInstruction struct {
 	// K is a constant parameter. The meaning depends on the value of OpCode.
 	K uint32
 }
+
+// Ancillary data offsets for socket filters, from
+// include/uapi/linux/filter.h. Loads at SKF_AD_OFF plus one of the SKF_AD_*
+// values load packet metadata instead of packet data.
+const (
+	SKF_AD_OFF      = 0xfffff000 // -0x1000
+	SKF_AD_PROTOCOL = 0
+	SKF_AD_PKTTYPE  = 4
+	SKF_AD_IFINDEX  = 8
+)
+
+// SizeOfSockFprog is the size of struct sock_fprog on 64-bit platforms.
+const SizeOfSockFprog = 16
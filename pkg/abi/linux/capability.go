@@ -192,3 +192,27 @@ type CapUserData struct {
 	Permitted   uint32
 	Inheritable uint32
 }
+
+// Constants for the security.capability extended attribute, which stores the
+// capabilities of an executable file, defined in Linux's
+// include/uapi/linux/capability.h.
+const (
+	VFS_CAP_REVISION_MASK   = 0xFF000000
+	VFS_CAP_REVISION_SHIFT  = 24
+	VFS_CAP_FLAGS_MASK      = 0x00FFFFFF
+	VFS_CAP_FLAGS_EFFECTIVE = 0x000001
+
+	VFS_CAP_REVISION_1 = 0x01000000
+	VFS_CAP_U32_1      = 1
+	XATTR_CAPS_SZ_1    = 4 * (1 + 2*VFS_CAP_U32_1)
+
+	VFS_CAP_REVISION_2 = 0x02000000
+	VFS_CAP_U32_2      = 2
+	XATTR_CAPS_SZ_2    = 4 * (1 + 2*VFS_CAP_U32_2)
+
+	// VFS_CAP_REVISION_3 adds the root UID of the user namespace in which
+	// the file capabilities were set.
+	VFS_CAP_REVISION_3 = 0x03000000
+	VFS_CAP_U32_3      = 2
+	XATTR_CAPS_SZ_3    = 4 * (2 + 2*VFS_CAP_U32_3)
+)
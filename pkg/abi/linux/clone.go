@@ -18,6 +18,9 @@ package linux
 const (
 	CSIGNAL = 0xff
 
+	// Only passable via clone3(2) and unshare(2), since it overlaps CSIGNAL.
+	CLONE_NEWTIME = 0x80
+
 	CLONE_VM             = 0x100
 	CLONE_FS             = 0x200
 	CLONE_FILES          = 0x400
@@ -48,7 +51,20 @@ const (
 	CLONE_INTO_CGROUP   = 0x200000000
 )
 
+// Sizes of published versions of struct clone_args, from
+// include/uapi/linux/sched.h.
+const (
+	CLONE_ARGS_SIZE_VER0 = 64
+	CLONE_ARGS_SIZE_VER1 = 80
+	CLONE_ARGS_SIZE_VER2 = 88
+)
+
+// PIDFD_NONBLOCK is the flag of pidfd_open(2), from include/uapi/linux/pidfd.h.
+const PIDFD_NONBLOCK = O_NONBLOCK
+
 // CloneArgs is struct clone_args, from include/uapi/linux/sched.h.
+//
+// +marshal
 type CloneArgs struct {
 	Flags      uint64
 	Pidfd      uint64
@@ -100,6 +100,15 @@ const (
 	// NT_PRFPREG is for float point register.
 	NT_PRFPREG = 0x2
 
+	// NT_PRPSINFO is for process information (struct elf_prpsinfo).
+	NT_PRPSINFO = 0x3
+
+	// NT_AUXV is for the auxiliary vector.
+	NT_AUXV = 0x6
+
+	// NT_SIGINFO is for the siginfo_t of the signal that caused a core dump.
+	NT_SIGINFO = 0x53494749
+
 	// NT_X86_XSTATE is for x86 extended state using xsave.
 	NT_X86_XSTATE = 0x202
 
@@ -156,3 +165,77 @@ type ElfProg64 struct {
 	Memsz  uint64 // Size of contents in memory.
 	Align  uint64 // Alignment in memory and file.
 }
+
+// ElfNoteHeader64 is the ELF64 note header.
+//
+// +marshal
+type ElfNoteHeader64 struct {
+	Namesz uint32 // Size of name, including the terminating NUL.
+	Descsz uint32 // Size of descriptor.
+	Type   uint32 // Note type.
+}
+
+// ElfPrstatusHeader is the architecture-independent prefix of struct
+// elf_prstatus, which describes a thread in an ELF core dump. In struct
+// elf_prstatus, it is followed by the thread's general purpose registers and
+// int pr_fpvalid.
+//
+// +marshal
+type ElfPrstatusHeader struct {
+	Signo   int32 // Signal number.
+	Code    int32 // Signal code.
+	Errno   int32 // errno.
+	Cursig  int16 // Current signal.
+	_       [2]byte
+	Sigpend uint64 // Set of pending signals.
+	Sighold uint64 // Set of blocked signals.
+	Pid     int32
+	Ppid    int32
+	Pgrp    int32
+	Sid     int32
+	Utime   Timeval // User time.
+	Stime   Timeval // System time.
+	Cutime  Timeval // Cumulative user time.
+	Cstime  Timeval // Cumulative system time.
+}
+
+// ElfPrpsinfo is struct elf_prpsinfo, which describes a process in an ELF
+// core dump.
+//
+// +marshal
+type ElfPrpsinfo struct {
+	State  byte // Numeric process state.
+	Sname  byte // Char for State.
+	Zomb   byte
+	Nice   int8
+	_      [4]byte
+	Flag   uint64
+	UID    uint32
+	GID    uint32
+	Pid    int32
+	Ppid   int32
+	Pgrp   int32
+	Sid    int32
+	Fname  [16]byte // Filename of executable.
+	Psargs [80]byte // Initial part of arg list.
+}
+
+// Core dump filter bits, as in /proc/[pid]/coredump_filter. See
+// include/linux/sched/coredump.h.
+const (
+	MMF_DUMP_ANON_PRIVATE    = 1 << 0
+	MMF_DUMP_ANON_SHARED     = 1 << 1
+	MMF_DUMP_MAPPED_PRIVATE  = 1 << 2
+	MMF_DUMP_MAPPED_SHARED   = 1 << 3
+	MMF_DUMP_ELF_HEADERS     = 1 << 4
+	MMF_DUMP_HUGETLB_PRIVATE = 1 << 5
+	MMF_DUMP_HUGETLB_SHARED  = 1 << 6
+	MMF_DUMP_DAX_PRIVATE     = 1 << 7
+	MMF_DUMP_DAX_SHARED      = 1 << 8
+
+	// MMF_DUMP_FILTER_MASK is the set of all core dump filter bits.
+	MMF_DUMP_FILTER_MASK = (1 << 9) - 1
+
+	// MMF_DUMP_FILTER_DEFAULT is the default core dump filter.
+	MMF_DUMP_FILTER_DEFAULT = MMF_DUMP_ANON_PRIVATE | MMF_DUMP_ANON_SHARED | MMF_DUMP_ELF_HEADERS | MMF_DUMP_HUGETLB_PRIVATE
+)
@@ -39,6 +39,11 @@ const (
 	// EP_PRIVATE_BITS is fs/eventpoll.c:EP_PRIVATE_BITS, the set of all bits
 	// in an epoll event mask that correspond to flags rather than I/O events.
 	EP_PRIVATE_BITS = EPOLLEXCLUSIVE | EPOLLWAKEUP | EPOLLONESHOT | EPOLLET
+
+	// EPOLLEXCLUSIVE_OK_BITS is fs/eventpoll.c:EPOLLEXCLUSIVE_OK_BITS, the
+	// set of bits that may be set in an event mask along with
+	// EPOLLEXCLUSIVE.
+	EPOLLEXCLUSIVE_OK_BITS = EPOLLIN | EPOLLOUT | EPOLLERR | EPOLLHUP | EPOLLWAKEUP | EPOLLET | EPOLLEXCLUSIVE
 )
 
 // Operation flags.
@@ -20,12 +20,29 @@ import (
 
 // Socket error origin codes as defined in include/uapi/linux/errqueue.h.
 const (
-	SO_EE_ORIGIN_NONE  = 0
-	SO_EE_ORIGIN_LOCAL = 1
-	SO_EE_ORIGIN_ICMP  = 2
-	SO_EE_ORIGIN_ICMP6 = 3
+	SO_EE_ORIGIN_NONE     = 0
+	SO_EE_ORIGIN_LOCAL    = 1
+	SO_EE_ORIGIN_ICMP     = 2
+	SO_EE_ORIGIN_ICMP6    = 3
+	SO_EE_ORIGIN_TXSTATUS = 4
+	SO_EE_ORIGIN_ZEROCOPY = 5
+
+	SO_EE_ORIGIN_TIMESTAMPING = SO_EE_ORIGIN_TXSTATUS
+)
+
+// Timestamp types reported in the Info field of SO_EE_ORIGIN_TIMESTAMPING
+// errors, as defined in include/uapi/linux/errqueue.h.
+const (
+	SCM_TSTAMP_SND   = 0
+	SCM_TSTAMP_SCHED = 1
+	SCM_TSTAMP_ACK   = 2
 )
 
+// SO_EE_CODE_ZEROCOPY_COPIED is set in the code of MSG_ZEROCOPY notifications
+// if the data was copied rather than sent without copying, as defined in
+// include/uapi/linux/errqueue.h.
+const SO_EE_CODE_ZEROCOPY_COPIED = 1
+
 // SockExtendedErr represents struct sock_extended_err in Linux defined in
 // include/uapi/linux/errqueue.h.
 //
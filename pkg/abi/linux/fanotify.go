@@ -0,0 +1,105 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Fanotify events, from include/uapi/linux/fanotify.h.
+const (
+	// FAN_ACCESS indicates a file was accessed.
+	FAN_ACCESS = 0x00000001
+	// FAN_MODIFY indicates a file was modified.
+	FAN_MODIFY = 0x00000002
+	// FAN_ATTRIB indicates a file's metadata changed.
+	FAN_ATTRIB = 0x00000004
+	// FAN_CLOSE_WRITE indicates a writable file was closed.
+	FAN_CLOSE_WRITE = 0x00000008
+	// FAN_CLOSE_NOWRITE indicates a non-writable file was closed.
+	FAN_CLOSE_NOWRITE = 0x00000010
+	// FAN_OPEN indicates a file was opened.
+	FAN_OPEN = 0x00000020
+	// FAN_Q_OVERFLOW indicates the event queue overflowed.
+	FAN_Q_OVERFLOW = 0x00004000
+	// FAN_OPEN_PERM is a permission event for opening a file.
+	FAN_OPEN_PERM = 0x00010000
+	// FAN_ACCESS_PERM is a permission event for accessing a file.
+	FAN_ACCESS_PERM = 0x00020000
+	// FAN_OPEN_EXEC_PERM is a permission event for opening a file for
+	// execution.
+	FAN_OPEN_EXEC_PERM = 0x00040000
+	// FAN_EVENT_ON_CHILD indicates that a directory mark also applies to the
+	// directory's immediate children.
+	FAN_EVENT_ON_CHILD = 0x08000000
+	// FAN_ONDIR indicates that events on directories should be reported, and
+	// is set in the mask of such events.
+	FAN_ONDIR = 0x40000000
+
+	// FAN_CLOSE is the union of FAN_CLOSE_WRITE and FAN_CLOSE_NOWRITE.
+	FAN_CLOSE = FAN_CLOSE_WRITE | FAN_CLOSE_NOWRITE
+)
+
+// Flags for fanotify_init(2).
+const (
+	FAN_CLOEXEC           = 0x00000001
+	FAN_NONBLOCK          = 0x00000002
+	FAN_CLASS_NOTIF       = 0x00000000
+	FAN_CLASS_CONTENT     = 0x00000004
+	FAN_CLASS_PRE_CONTENT = 0x00000008
+	FAN_ALL_CLASS_BITS    = FAN_CLASS_NOTIF | FAN_CLASS_CONTENT | FAN_CLASS_PRE_CONTENT
+	FAN_UNLIMITED_QUEUE   = 0x00000010
+	FAN_UNLIMITED_MARKS   = 0x00000020
+)
+
+// Flags for fanotify_mark(2).
+const (
+	FAN_MARK_ADD                 = 0x00000001
+	FAN_MARK_REMOVE              = 0x00000002
+	FAN_MARK_DONT_FOLLOW         = 0x00000004
+	FAN_MARK_ONLYDIR             = 0x00000008
+	FAN_MARK_IGNORED_MASK        = 0x00000020
+	FAN_MARK_IGNORED_SURV_MODIFY = 0x00000040
+	FAN_MARK_FLUSH               = 0x00000080
+	FAN_MARK_INODE               = 0x00000000
+	FAN_MARK_MOUNT               = 0x00000010
+	FAN_MARK_FILESYSTEM          = 0x00000100
+)
+
+// Default limits for fanotify groups created without FAN_UNLIMITED_QUEUE and
+// FAN_UNLIMITED_MARKS, from fs/notify/fanotify/fanotify_user.c.
+const (
+	FANOTIFY_DEFAULT_MAX_EVENTS = 16384
+	FANOTIFY_DEFAULT_MAX_MARKS  = 8192
+)
+
+// FANOTIFY_METADATA_VERSION is the version of struct fanotify_event_metadata.
+const FANOTIFY_METADATA_VERSION = 3
+
+// FAN_NOFD is the fd reported in events that have no associated file, such as
+// FAN_Q_OVERFLOW.
+const FAN_NOFD = -1
+
+// FanotifyEventMetadata is equivalent to struct fanotify_event_metadata.
+//
+// +marshal
+type FanotifyEventMetadata struct {
+	EventLen    uint32
+	Vers        uint8
+	Reserved    uint8
+	MetadataLen uint16
+	Mask        uint64
+	FD          int32
+	PID         int32
+}
+
+// FAN_EVENT_METADATA_LEN is the size of struct fanotify_event_metadata.
+const FAN_EVENT_METADATA_LEN = 24
@@ -202,6 +202,10 @@ const (
 	RWF_DSYNC = 0x00000002
 	RWF_SYNC  = 0x00000004
 	RWF_VALID = RWF_HIPRI | RWF_DSYNC | RWF_SYNC
+
+	// RWF_NOWAIT is only supported by preadv2, by some filesystems, and so
+	// isn't included in RWF_VALID.
+	RWF_NOWAIT = 0x00000008
 )
 
 // SizeOfStat is the size of a Stat struct.
@@ -400,3 +404,27 @@ const (
 	CLOSE_RANGE_UNSHARE = uint32(1 << 1)
 	CLOSE_RANGE_CLOEXEC = uint32(1 << 2)
 )
+
+// Constants related to name_to_handle_at(2) and open_by_handle_at(2).
+// Source: include/linux/exportfs.h, include/uapi/linux/fcntl.h
+const (
+	// MAX_HANDLE_SZ is the maximum size of a file handle's f_handle.
+	MAX_HANDLE_SZ = 128
+
+	// AT_HANDLE_FID requests a file handle that is only used to identify
+	// the file, and need not be usable with open_by_handle_at(2).
+	AT_HANDLE_FID = 0x200
+
+	// FILEID_INO64_GEN is a file handle containing a 64-bit inode number
+	// followed by a 32-bit generation number.
+	FILEID_INO64_GEN = 0x81
+)
+
+// FileHandle is struct file_handle, from include/linux/fs.h, without its
+// variable-length f_handle field.
+//
+// +marshal
+type FileHandle struct {
+	HandleBytes uint32
+	HandleType  int32
+}
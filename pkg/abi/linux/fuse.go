@@ -1045,3 +1045,12 @@ type FUSEFsyncIn struct {
 	// padding
 	_ uint32
 }
+
+// FUSEInterruptIn is the request sent by the kernel to the daemon to interrupt
+// a request that a task is blocked on.
+//
+// +marshal
+type FUSEInterruptIn struct {
+	// Unique is the unique identifier of the interrupted request.
+	Unique FUSEOpID
+}
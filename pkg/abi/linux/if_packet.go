@@ -0,0 +1,146 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Socket options for SOL_PACKET, from uapi/linux/if_packet.h.
+const (
+	PACKET_ADD_MEMBERSHIP  = 1
+	PACKET_DROP_MEMBERSHIP = 2
+	PACKET_RECV_OUTPUT     = 3
+	PACKET_RX_RING         = 5
+	PACKET_STATISTICS      = 6
+	PACKET_COPY_THRESH     = 7
+	PACKET_AUXDATA         = 8
+	PACKET_ORIGDEV         = 9
+	PACKET_VERSION         = 10
+	PACKET_HDRLEN          = 11
+	PACKET_RESERVE         = 12
+	PACKET_TX_RING         = 13
+	PACKET_LOSS            = 14
+	PACKET_VNET_HDR        = 15
+	PACKET_TX_TIMESTAMP    = 16
+	PACKET_TIMESTAMP       = 17
+	PACKET_FANOUT          = 18
+	PACKET_TX_HAS_OFF      = 19
+	PACKET_QDISC_BYPASS    = 20
+	PACKET_ROLLOVER_STATS  = 21
+	PACKET_FANOUT_DATA     = 22
+	PACKET_IGNORE_OUTGOING = 23
+)
+
+// Packet ring versions, from uapi/linux/if_packet.h:enum tpacket_versions.
+const (
+	TPACKET_V1 = 0
+	TPACKET_V2 = 1
+	TPACKET_V3 = 2
+)
+
+// Packet ring frame and block status flags, from uapi/linux/if_packet.h.
+const (
+	TP_STATUS_KERNEL       = 0
+	TP_STATUS_USER         = 1 << 0
+	TP_STATUS_COPY         = 1 << 1
+	TP_STATUS_LOSING       = 1 << 2
+	TP_STATUS_CSUMNOTREADY = 1 << 3
+	TP_STATUS_VLAN_VALID   = 1 << 4
+	TP_STATUS_BLK_TMO      = 1 << 5
+)
+
+// TPACKET_ALIGNMENT is the alignment of packet ring frame headers, from
+// uapi/linux/if_packet.h.
+const TPACKET_ALIGNMENT = 16
+
+// TPacketAlign aligns x to TPACKET_ALIGNMENT, as TPACKET_ALIGN does in
+// uapi/linux/if_packet.h.
+func TPacketAlign(x uint32) uint32 {
+	return (x + TPACKET_ALIGNMENT - 1) &^ (TPACKET_ALIGNMENT - 1)
+}
+
+// Packet ring header lengths, as reported by getsockopt(PACKET_HDRLEN). Each
+// is the aligned size of the version's frame header followed by a struct
+// sockaddr_ll.
+const (
+	TPACKET_HDRLEN  = 52
+	TPACKET2_HDRLEN = 52
+	TPACKET3_HDRLEN = 68
+)
+
+// TpacketReq3 is struct tpacket_req3, from uapi/linux/if_packet.h.
+//
+// +marshal
+type TpacketReq3 struct {
+	BlockSize      uint32
+	BlockNr        uint32
+	FrameSize      uint32
+	FrameNr        uint32
+	RetireBlkTov   uint32
+	SizeofPriv     uint32
+	FeatureReqWord uint32
+}
+
+// TpacketStats is struct tpacket_stats, from uapi/linux/if_packet.h.
+//
+// +marshal
+type TpacketStats struct {
+	Packets uint32
+	Drops   uint32
+}
+
+// TpacketStatsV3 is struct tpacket_stats_v3, from uapi/linux/if_packet.h.
+//
+// +marshal
+type TpacketStatsV3 struct {
+	Packets    uint32
+	Drops      uint32
+	FreezeQCnt uint32
+}
+
+// TpacketBlockDesc is struct tpacket_block_desc with the struct
+// tpacket_hdr_v1 block header flattened into it, from
+// uapi/linux/if_packet.h.
+//
+// +marshal
+type TpacketBlockDesc struct {
+	Version          uint32
+	OffsetToPriv     uint32
+	BlockStatus      uint32
+	NumPkts          uint32
+	OffsetToFirstPkt uint32
+	BlkLen           uint32
+	SeqNum           uint64
+	TsFirstPktSec    uint32
+	TsFirstPktNsec   uint32
+	TsLastPktSec     uint32
+	TsLastPktNsec    uint32
+}
+
+// Tpacket3Hdr is struct tpacket3_hdr, from uapi/linux/if_packet.h.
+//
+// +marshal
+type Tpacket3Hdr struct {
+	NextOffset uint32
+	Sec        uint32
+	Nsec       uint32
+	Snaplen    uint32
+	Len        uint32
+	Status     uint32
+	Mac        uint16
+	Net        uint16
+	RxHash     uint32
+	VlanTCI    uint32
+	VlanTPID   uint16
+	_          [2]byte
+	_          [8]byte
+}
@@ -125,6 +125,16 @@ var (
 	KCOV_DISABLE    = IOC(_IOC_NONE, 'c', 101, 0)
 )
 
+// Random ioctls from uapi/linux/random.h.
+var (
+	RNDGETENTCNT   = IOC(_IOC_READ, 'R', 0x00, 4)
+	RNDADDTOENTCNT = IOC(_IOC_WRITE, 'R', 0x01, 4)
+	RNDADDENTROPY  = IOC(_IOC_WRITE, 'R', 0x03, 8)
+	RNDZAPENTCNT   = IOC(_IOC_NONE, 'R', 0x04, 0)
+	RNDCLEARPOOL   = IOC(_IOC_NONE, 'R', 0x06, 0)
+	RNDRESEEDCRNG  = IOC(_IOC_NONE, 'R', 0x07, 0)
+)
+
 // Kcov trace types from kernel/kcov.h.
 const (
 	KCOV_TRACE_PC  = 0
@@ -28,9 +28,59 @@ const (
 
 // Constants for IoUringParams.Features. See include/uapi/linux/io_uring.h.
 const (
-	IORING_FEAT_SINGLE_MMAP = (1 << 0)
+	IORING_FEAT_SINGLE_MMAP     = (1 << 0)
+	IORING_FEAT_NODROP          = (1 << 1)
+	IORING_FEAT_SUBMIT_STABLE   = (1 << 2)
+	IORING_FEAT_RW_CUR_POS      = (1 << 3)
+	IORING_FEAT_CUR_PERSONALITY = (1 << 4)
 )
 
+// Constants for io_uring_enter(2). See include/uapi/linux/io_uring.h.
+const (
+	IORING_ENTER_GETEVENTS = (1 << 0)
+	IORING_ENTER_SQ_WAKEUP = (1 << 1)
+	IORING_ENTER_SQ_WAIT   = (1 << 2)
+	IORING_ENTER_EXT_ARG   = (1 << 3)
+)
+
+// Constants for IOUringSqe.Opcode. See include/uapi/linux/io_uring.h.
+const (
+	IORING_OP_NOP    = 0
+	IORING_OP_READV  = 1
+	IORING_OP_WRITEV = 2
+	IORING_OP_FSYNC  = 3
+	IORING_OP_READ   = 22
+	IORING_OP_WRITE  = 23
+	IORING_OP_LAST   = 48
+)
+
+// Constants for IOUringSqe.Flags. See include/uapi/linux/io_uring.h.
+const (
+	IOSQE_FIXED_FILE    = (1 << 0)
+	IOSQE_IO_DRAIN      = (1 << 1)
+	IOSQE_IO_LINK       = (1 << 2)
+	IOSQE_IO_HARDLINK   = (1 << 3)
+	IOSQE_ASYNC         = (1 << 4)
+	IOSQE_BUFFER_SELECT = (1 << 5)
+)
+
+// IORING_FSYNC_DATASYNC is the only flag for IORING_OP_FSYNC. See
+// include/uapi/linux/io_uring.h.
+const IORING_FSYNC_DATASYNC = (1 << 0)
+
+// Opcodes for io_uring_register(2). See include/uapi/linux/io_uring.h.
+const (
+	IORING_REGISTER_BUFFERS   = 0
+	IORING_UNREGISTER_BUFFERS = 1
+	IORING_REGISTER_FILES     = 2
+	IORING_UNREGISTER_FILES   = 3
+	IORING_REGISTER_PROBE     = 8
+)
+
+// IO_URING_OP_SUPPORTED is set in IOUringProbeOp.Flags for supported
+// opcodes. See include/uapi/linux/io_uring.h.
+const IO_URING_OP_SUPPORTED = (1 << 0)
+
 // Constants for IO_URING. See include/uapi/linux/io_uring.h.
 const (
 	IORING_SETUP_COOP_TASKRUN = (1 << 8)
@@ -161,12 +211,12 @@ type IORings struct {
 type IOUringSqe struct {
 	Opcode              uint8
 	Flags               uint8
-	ioPrio              uint16
-	fd                  int32
-	offOrAddrOrCmdOp    uint64
-	addrOrSpliceOff     uint64
-	len                 uint32
-	specialFlags        uint32
+	IoPrio              uint16
+	Fd                  int32
+	OffOrAddrOrCmdOp    uint64
+	AddrOrSpliceOff     uint64
+	Len                 uint32
+	SpecialFlags        uint32
 	UserData            uint64
 	bufIndexOrGroup     uint16
 	personality         uint16
@@ -174,3 +224,26 @@ type IOUringSqe struct {
 	addr3               uint64
 	_                   uint64
 }
+
+// IOUringProbeOp implements io_uring_probe_op struct.
+// See include/uapi/linux/io_uring.h.
+//
+// +marshal slice:IOUringProbeOpSlice
+type IOUringProbeOp struct {
+	Op    uint8
+	_     uint8
+	Flags uint16
+	_     uint32
+}
+
+// IOUringProbe implements io_uring_probe struct without the trailing array of
+// IOUringProbeOp, which the caller sizes by OpsLen.
+// See include/uapi/linux/io_uring.h.
+//
+// +marshal
+type IOUringProbe struct {
+	LastOp uint8
+	OpsLen uint8
+	_      uint16
+	_      [3]uint32
+}
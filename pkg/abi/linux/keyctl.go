@@ -0,0 +1,95 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Special key serial numbers, from include/uapi/linux/keyctl.h.
+const (
+	KEY_SPEC_THREAD_KEYRING       = -1
+	KEY_SPEC_PROCESS_KEYRING      = -2
+	KEY_SPEC_SESSION_KEYRING      = -3
+	KEY_SPEC_USER_KEYRING         = -4
+	KEY_SPEC_USER_SESSION_KEYRING = -5
+	KEY_SPEC_GROUP_KEYRING        = -6
+	KEY_SPEC_REQKEY_AUTH_KEY      = -7
+)
+
+// keyctl(2) operations, from include/uapi/linux/keyctl.h.
+const (
+	KEYCTL_GET_KEYRING_ID       = 0
+	KEYCTL_JOIN_SESSION_KEYRING = 1
+	KEYCTL_UPDATE               = 2
+	KEYCTL_REVOKE               = 3
+	KEYCTL_CHOWN                = 4
+	KEYCTL_SETPERM              = 5
+	KEYCTL_DESCRIBE             = 6
+	KEYCTL_CLEAR                = 7
+	KEYCTL_LINK                 = 8
+	KEYCTL_UNLINK               = 9
+	KEYCTL_SEARCH               = 10
+	KEYCTL_READ                 = 11
+)
+
+// Key permissions, from include/linux/key.h. Each of the possessor, user,
+// group and other permission masks is a combination of KEY_*_VIEW, READ,
+// WRITE, SEARCH, LINK and SETATTR.
+const (
+	KEY_POS_VIEW    = 0x01000000
+	KEY_POS_READ    = 0x02000000
+	KEY_POS_WRITE   = 0x04000000
+	KEY_POS_SEARCH  = 0x08000000
+	KEY_POS_LINK    = 0x10000000
+	KEY_POS_SETATTR = 0x20000000
+	KEY_POS_ALL     = 0x3f000000
+
+	KEY_USR_VIEW    = 0x00010000
+	KEY_USR_READ    = 0x00020000
+	KEY_USR_WRITE   = 0x00040000
+	KEY_USR_SEARCH  = 0x00080000
+	KEY_USR_LINK    = 0x00100000
+	KEY_USR_SETATTR = 0x00200000
+	KEY_USR_ALL     = 0x003f0000
+
+	KEY_GRP_VIEW    = 0x00000100
+	KEY_GRP_READ    = 0x00000200
+	KEY_GRP_WRITE   = 0x00000400
+	KEY_GRP_SEARCH  = 0x00000800
+	KEY_GRP_LINK    = 0x00001000
+	KEY_GRP_SETATTR = 0x00002000
+	KEY_GRP_ALL     = 0x00003f00
+
+	KEY_OTH_VIEW    = 0x00000001
+	KEY_OTH_READ    = 0x00000002
+	KEY_OTH_WRITE   = 0x00000004
+	KEY_OTH_SEARCH  = 0x00000008
+	KEY_OTH_LINK    = 0x00000010
+	KEY_OTH_SETATTR = 0x00000020
+	KEY_OTH_ALL     = 0x0000003f
+)
+
+// Key quota defaults, from security/keys/key.c.
+const (
+	KEY_QUOTA_MAXKEYS       = 200
+	KEY_QUOTA_MAXBYTES      = 20000
+	KEY_QUOTA_ROOT_MAXKEYS  = 1000000
+	KEY_QUOTA_ROOT_MAXBYTES = 25000000
+)
+
+// KEY_USER_MAX_PAYLOAD is the maximum length of the payload of a "user" key,
+// from security/keys/user_defined.c.
+const KEY_USER_MAX_PAYLOAD = 32767
+
+// KEY_MAX_DESC_SIZE is the maximum length of a key description, from
+// security/keys/internal.h.
+const KEY_MAX_DESC_SIZE = 4096
@@ -0,0 +1,79 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// landlock_create_ruleset(2) flags, from include/uapi/linux/landlock.h.
+const (
+	LANDLOCK_CREATE_RULESET_VERSION = (1 << 0)
+)
+
+// Landlock rule types, from include/uapi/linux/landlock.h.
+const (
+	LANDLOCK_RULE_PATH_BENEATH = 1
+)
+
+// Landlock filesystem access rights, from include/uapi/linux/landlock.h.
+const (
+	LANDLOCK_ACCESS_FS_EXECUTE     = (1 << 0)
+	LANDLOCK_ACCESS_FS_WRITE_FILE  = (1 << 1)
+	LANDLOCK_ACCESS_FS_READ_FILE   = (1 << 2)
+	LANDLOCK_ACCESS_FS_READ_DIR    = (1 << 3)
+	LANDLOCK_ACCESS_FS_REMOVE_DIR  = (1 << 4)
+	LANDLOCK_ACCESS_FS_REMOVE_FILE = (1 << 5)
+	LANDLOCK_ACCESS_FS_MAKE_CHAR   = (1 << 6)
+	LANDLOCK_ACCESS_FS_MAKE_DIR    = (1 << 7)
+	LANDLOCK_ACCESS_FS_MAKE_REG    = (1 << 8)
+	LANDLOCK_ACCESS_FS_MAKE_SOCK   = (1 << 9)
+	LANDLOCK_ACCESS_FS_MAKE_FIFO   = (1 << 10)
+	LANDLOCK_ACCESS_FS_MAKE_BLOCK  = (1 << 11)
+	LANDLOCK_ACCESS_FS_MAKE_SYM    = (1 << 12)
+)
+
+// Landlock ABI constants, from security/landlock/limits.h and
+// security/landlock/syscalls.c.
+const (
+	// LANDLOCK_ABI_VERSION is the Landlock ABI version implemented by the
+	// sentry. Version 1 supports the access rights up to
+	// LANDLOCK_ACCESS_FS_MAKE_SYM.
+	LANDLOCK_ABI_VERSION = 1
+
+	// LANDLOCK_MAX_NUM_LAYERS is the maximum number of rulesets that can be
+	// stacked on a task.
+	LANDLOCK_MAX_NUM_LAYERS = 16
+
+	// LANDLOCK_MASK_ACCESS_FS is the set of all filesystem access rights
+	// supported by LANDLOCK_ABI_VERSION.
+	LANDLOCK_MASK_ACCESS_FS = (LANDLOCK_ACCESS_FS_MAKE_SYM << 1) - 1
+
+	// LANDLOCK_ACCESS_FILE is the set of filesystem access rights that apply
+	// to files that are not directories.
+	LANDLOCK_ACCESS_FILE = LANDLOCK_ACCESS_FS_EXECUTE | LANDLOCK_ACCESS_FS_WRITE_FILE | LANDLOCK_ACCESS_FS_READ_FILE
+)
+
+// LandlockRulesetAttr is equivalent to struct landlock_ruleset_attr.
+//
+// +marshal
+type LandlockRulesetAttr struct {
+	HandledAccessFS uint64
+}
+
+// SizeOfLandlockPathBeneathAttr is the size of struct
+// landlock_path_beneath_attr, which Linux makes __attribute__((packed)):
+//
+//	struct landlock_path_beneath_attr {
+//		__u64 allowed_access;
+//		__s32 parent_fd;
+//	};
+const SizeOfLandlockPathBeneathAttr = 12
@@ -77,6 +77,8 @@ const (
 	MADV_NOHUGEPAGE   = 15
 	MADV_DONTDUMP     = 16
 	MADV_DODUMP       = 17
+	MADV_COLD         = 20
+	MADV_PAGEOUT      = 21
 	MADV_HWPOISON     = 100
 	MADV_SOFT_OFFLINE = 101
 	MADV_NOMAJFAULT   = 200
@@ -128,3 +130,22 @@ const (
 
 	MPOL_MF_VALID = MPOL_MF_STRICT | MPOL_MF_MOVE | MPOL_MF_MOVE_ALL
 )
+
+// CachestatRange is struct cachestat_range, from uapi/linux/mman.h.
+//
+// +marshal
+type CachestatRange struct {
+	Off uint64
+	Len uint64
+}
+
+// Cachestat is struct cachestat, from uapi/linux/mman.h.
+//
+// +marshal
+type Cachestat struct {
+	NrCache           uint64
+	NrDirty           uint64
+	NrWriteback       uint64
+	NrEvicted         uint64
+	NrRecentlyEvicted uint64
+}
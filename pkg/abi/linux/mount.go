@@ -0,0 +1,91 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Constants for the flags arguments of the new mount API syscalls, e.g.
+// open_tree(2) and mount_setattr(2).
+const (
+	AT_NO_AUTOMOUNT = 0x800
+	AT_RECURSIVE    = 0x8000
+)
+
+// Constants for open_tree(2).
+const (
+	OPEN_TREE_CLONE   = 0x1
+	OPEN_TREE_CLOEXEC = O_CLOEXEC
+)
+
+// Constants for move_mount(2).
+const (
+	MOVE_MOUNT_F_SYMLINKS   = 0x1
+	MOVE_MOUNT_F_AUTOMOUNTS = 0x2
+	MOVE_MOUNT_F_EMPTY_PATH = 0x4
+	MOVE_MOUNT_T_SYMLINKS   = 0x10
+	MOVE_MOUNT_T_AUTOMOUNTS = 0x20
+	MOVE_MOUNT_T_EMPTY_PATH = 0x40
+	MOVE_MOUNT_SET_GROUP    = 0x100
+	MOVE_MOUNT_BENEATH      = 0x200
+)
+
+// Constants for fsopen(2).
+const (
+	FSOPEN_CLOEXEC = 0x1
+)
+
+// Commands for fsconfig(2).
+const (
+	FSCONFIG_SET_FLAG        = 0
+	FSCONFIG_SET_STRING      = 1
+	FSCONFIG_SET_BINARY      = 2
+	FSCONFIG_SET_PATH        = 3
+	FSCONFIG_SET_PATH_EMPTY  = 4
+	FSCONFIG_SET_FD          = 5
+	FSCONFIG_CMD_CREATE      = 6
+	FSCONFIG_CMD_RECONFIGURE = 7
+)
+
+// Constants for fsmount(2).
+const (
+	FSMOUNT_CLOEXEC = 0x1
+)
+
+// Mount attributes for fsmount(2) and mount_setattr(2).
+const (
+	MOUNT_ATTR_RDONLY      = 0x1
+	MOUNT_ATTR_NOSUID      = 0x2
+	MOUNT_ATTR_NODEV       = 0x4
+	MOUNT_ATTR_NOEXEC      = 0x8
+	MOUNT_ATTR__ATIME      = 0x70
+	MOUNT_ATTR_RELATIME    = 0x0
+	MOUNT_ATTR_NOATIME     = 0x10
+	MOUNT_ATTR_STRICTATIME = 0x20
+	MOUNT_ATTR_NODIRATIME  = 0x80
+	MOUNT_ATTR_IDMAP       = 0x100000
+	MOUNT_ATTR_NOSYMFOLLOW = 0x200000
+)
+
+// MOUNT_ATTR_SIZE_VER0 is the size of the first published version of
+// struct mount_attr.
+const MOUNT_ATTR_SIZE_VER0 = 32
+
+// MountAttr is struct mount_attr, from uapi/linux/mount.h.
+//
+// +marshal
+type MountAttr struct {
+	AttrSet     uint64
+	AttrClr     uint64
+	Propagation uint64
+	UsernsFD    uint64
+}
@@ -402,6 +402,51 @@ type XTSNATTarget struct {
 // SizeOfXTSNATTarget is the size of an XTSNATTarget.
 const SizeOfXTSNATTarget = 56
 
+// XTTPROXYTargetInfo holds data for the TPROXY target, revision 0. It
+// corresponds to struct xt_tproxy_target_info in
+// include/uapi/linux/netfilter/xt_TPROXY.h.
+//
+// +marshal
+type XTTPROXYTargetInfo struct {
+	MarkMask  uint32
+	MarkValue uint32
+	LocalAddr [4]byte
+	LocalPort uint16
+	_         [2]byte
+}
+
+// SizeOfXTTPROXYTargetInfo is the size of an XTTPROXYTargetInfo.
+const SizeOfXTTPROXYTargetInfo = 16
+
+// XTTPROXYTargetInfoV1 holds data for the TPROXY target, revision 1. It
+// corresponds to struct xt_tproxy_target_info_v1 in
+// include/uapi/linux/netfilter/xt_TPROXY.h.
+//
+// +marshal
+type XTTPROXYTargetInfoV1 struct {
+	MarkMask  uint32
+	MarkValue uint32
+	LocalAddr [16]byte
+	LocalPort uint16
+	_         [2]byte
+}
+
+// SizeOfXTTPROXYTargetInfoV1 is the size of an XTTPROXYTargetInfoV1.
+const SizeOfXTTPROXYTargetInfoV1 = 28
+
+// XTMarkTargetInfoV2 holds data for the MARK target, revision 2. It
+// corresponds to struct xt_mark_tginfo2 in
+// include/uapi/linux/netfilter/xt_mark.h.
+//
+// +marshal
+type XTMarkTargetInfoV2 struct {
+	Mark uint32
+	Mask uint32
+}
+
+// SizeOfXTMarkTargetInfoV2 is the size of an XTMarkTargetInfoV2.
+const SizeOfXTMarkTargetInfoV2 = 8
+
 // IPTGetinfo is the argument for the IPT_SO_GET_INFO sockopt. It corresponds
 // to struct ipt_getinfo in include/uapi/linux/netfilter_ipv4/ip_tables.h.
 //
@@ -675,3 +720,28 @@ const (
 	// packets do not have an associated socket.
 	XT_OWNER_SOCKET = 1 << 2
 )
+
+// XTSocketMatchInfo holds data for matching packets with a local socket. It
+// corresponds to struct xt_socket_mtinfo1 in
+// include/uapi/linux/netfilter/xt_socket.h, which is used by revisions 1 to 3
+// of the socket match. Revision 0 has no data.
+//
+// +marshal
+type XTSocketMatchInfo struct {
+	// Flags is a bitmask of the XT_SOCKET_* flags below.
+	Flags uint8
+}
+
+// SizeOfXTSocketMatchInfo is the size of an XTSocketMatchInfo.
+const SizeOfXTSocketMatchInfo = 1
+
+// Flags in XTSocketMatchInfo.Flags. Corresponding constants are in
+// include/uapi/linux/netfilter/xt_socket.h.
+const (
+	// Only match transparent sockets.
+	XT_SOCKET_TRANSPARENT = 1 << 0
+	// Don't ignore sockets bound to the wildcard address.
+	XT_SOCKET_NOWILDCARD = 1 << 1
+	// Restore the packet's mark from the socket's mark.
+	XT_SOCKET_RESTORESKMARK = 1 << 2
+)
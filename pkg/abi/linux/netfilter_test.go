@@ -35,6 +35,10 @@ func TestSizes(t *testing.T) {
 		{XTEntryTarget{}, SizeOfXTEntryTarget},
 		{XTErrorTarget{}, SizeOfXTErrorTarget},
 		{XTStandardTarget{}, SizeOfXTStandardTarget},
+		{XTTPROXYTargetInfo{}, SizeOfXTTPROXYTargetInfo},
+		{XTTPROXYTargetInfoV1{}, SizeOfXTTPROXYTargetInfoV1},
+		{XTMarkTargetInfoV2{}, SizeOfXTMarkTargetInfoV2},
+		{XTSocketMatchInfo{}, SizeOfXTSocketMatchInfo},
 		{IP6TReplace{}, SizeOfIP6TReplace},
 		{IP6TEntry{}, SizeOfIP6TEntry},
 		{IP6TIP{}, SizeOfIP6TIP},
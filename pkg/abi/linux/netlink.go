@@ -81,6 +81,7 @@ const (
 	NLM_F_EXCL      = 0x200
 	NLM_F_CREATE    = 0x400
 	NLM_F_APPEND    = 0x800
+	NLM_F_NONREC    = 0x100
 )
 
 // Standard netlink message types, from uapi/linux/netlink.h.
@@ -115,6 +116,13 @@ const NetlinkAttrHeaderSize = 4
 // uapi/linux/netlink.h.
 const NLA_ALIGNTO = 4
 
+// Netlink attribute type flags, from uapi/linux/netlink.h.
+const (
+	NLA_F_NESTED        = 1 << 15
+	NLA_F_NET_BYTEORDER = 1 << 14
+	NLA_TYPE_MASK       = ^uint16(NLA_F_NESTED | NLA_F_NET_BYTEORDER)
+)
+
 // Socket options, from uapi/linux/netlink.h.
 const (
 	NETLINK_ADD_MEMBERSHIP   = 1
@@ -84,6 +84,23 @@ const (
 	RTM_GETNSID = 90
 )
 
+// Multicast groups for NETLINK_ROUTE sockets, from uapi/linux/rtnetlink.h.
+const (
+	RTNLGRP_NONE        = 0
+	RTNLGRP_LINK        = 1
+	RTNLGRP_NOTIFY      = 2
+	RTNLGRP_NEIGH       = 3
+	RTNLGRP_TC          = 4
+	RTNLGRP_IPV4_IFADDR = 5
+	RTNLGRP_IPV4_MROUTE = 6
+	RTNLGRP_IPV4_ROUTE  = 7
+	RTNLGRP_IPV4_RULE   = 8
+	RTNLGRP_IPV6_IFADDR = 9
+	RTNLGRP_IPV6_MROUTE = 10
+	RTNLGRP_IPV6_ROUTE  = 11
+	RTNLGRP_IPV6_IFINFO = 12
+)
+
 // InterfaceInfoMessage is struct ifinfomsg, from uapi/linux/rtnetlink.h.
 //
 // +marshal
@@ -189,6 +206,42 @@ const (
 	IFA_FLAGS     = 8
 )
 
+// Interface address flags, from uapi/linux/if_addr.h.
+const (
+	IFA_F_SECONDARY      = 0x01
+	IFA_F_TEMPORARY      = IFA_F_SECONDARY
+	IFA_F_NODAD          = 0x02
+	IFA_F_OPTIMISTIC     = 0x04
+	IFA_F_DADFAILED      = 0x08
+	IFA_F_HOMEADDRESS    = 0x10
+	IFA_F_DEPRECATED     = 0x20
+	IFA_F_TENTATIVE      = 0x40
+	IFA_F_PERMANENT      = 0x80
+	IFA_F_MANAGETEMPADDR = 0x100
+	IFA_F_NOPREFIXROUTE  = 0x200
+)
+
+// INFINITY_LIFE_TIME is the lifetime of an address that never expires, from
+// include/net/addrconf.h.
+const INFINITY_LIFE_TIME = 0xffffffff
+
+// InterfaceAddrCacheInfo is struct ifa_cacheinfo, from uapi/linux/if_addr.h.
+//
+// +marshal
+type InterfaceAddrCacheInfo struct {
+	// Preferred is the remaining preferred lifetime in seconds.
+	Preferred uint32
+
+	// Valid is the remaining valid lifetime in seconds.
+	Valid uint32
+
+	// Created is the creation timestamp in hundredths of seconds.
+	Created uint32
+
+	// Updated is the last update timestamp in hundredths of seconds.
+	Updated uint32
+}
+
 // Device types, from uapi/linux/if_arp.h.
 const (
 	ARPHRD_NONE     = 65534
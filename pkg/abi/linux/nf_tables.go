@@ -0,0 +1,393 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Netfilter netlink subsystems, from uapi/linux/netfilter/nfnetlink.h.
+const (
+	NFNL_SUBSYS_NONE     = 0
+	NFNL_SUBSYS_NFTABLES = 10
+)
+
+// NFNETLINK_V0 is the version of the netfilter netlink protocol, from
+// uapi/linux/netfilter/nfnetlink.h.
+const NFNETLINK_V0 = 0
+
+// Netfilter netlink batch message types and attributes, from
+// uapi/linux/netfilter/nfnetlink.h.
+const (
+	NFNL_MSG_BATCH_BEGIN = NLMSG_MIN_TYPE
+	NFNL_MSG_BATCH_END   = NLMSG_MIN_TYPE + 1
+
+	NFNL_BATCH_GENID = 1
+)
+
+// NetfilterGenMessage is struct nfgenmsg, from
+// uapi/linux/netfilter/nfnetlink.h.
+//
+// +marshal
+type NetfilterGenMessage struct {
+	Family  uint8
+	Version uint8
+
+	// ResourceID is in network byte order.
+	ResourceID uint16
+}
+
+// Netfilter protocol families, from uapi/linux/netfilter.h.
+const (
+	NFPROTO_UNSPEC = 0
+	NFPROTO_INET   = 1
+	NFPROTO_IPV4   = 2
+	NFPROTO_ARP    = 3
+	NFPROTO_NETDEV = 5
+	NFPROTO_BRIDGE = 7
+	NFPROTO_IPV6   = 10
+)
+
+// nf_tables limits, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_NAME_MAXLEN       = 256
+	NFT_TABLE_MAXNAMELEN  = NFT_NAME_MAXLEN
+	NFT_CHAIN_MAXNAMELEN  = NFT_NAME_MAXLEN
+	NFT_SET_MAXNAMELEN    = NFT_NAME_MAXLEN
+	NFT_USERDATA_MAXLEN   = 256
+	NFT_DATA_VALUE_MAXLEN = 64
+)
+
+// nf_tables registers, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_REG_VERDICT = 0
+	NFT_REG_1       = 1
+	NFT_REG_2       = 2
+	NFT_REG_3       = 3
+	NFT_REG_4       = 4
+	NFT_REG32_00    = 8
+	NFT_REG32_15    = 23
+
+	NFT_REG_SIZE   = 16
+	NFT_REG32_SIZE = 4
+)
+
+// nf_tables verdicts, from uapi/linux/netfilter/nf_tables.h. Verdicts may
+// also be NF_DROP or NF_ACCEPT.
+const (
+	NFT_CONTINUE = -1
+	NFT_BREAK    = -2
+	NFT_JUMP     = -3
+	NFT_GOTO     = -4
+	NFT_RETURN   = -5
+)
+
+// nf_tables message types, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_MSG_NEWTABLE   = 0
+	NFT_MSG_GETTABLE   = 1
+	NFT_MSG_DELTABLE   = 2
+	NFT_MSG_NEWCHAIN   = 3
+	NFT_MSG_GETCHAIN   = 4
+	NFT_MSG_DELCHAIN   = 5
+	NFT_MSG_NEWRULE    = 6
+	NFT_MSG_GETRULE    = 7
+	NFT_MSG_DELRULE    = 8
+	NFT_MSG_NEWSET     = 9
+	NFT_MSG_GETSET     = 10
+	NFT_MSG_DELSET     = 11
+	NFT_MSG_NEWSETELEM = 12
+	NFT_MSG_GETSETELEM = 13
+	NFT_MSG_DELSETELEM = 14
+	NFT_MSG_NEWGEN     = 15
+	NFT_MSG_GETGEN     = 16
+)
+
+// nf_tables list attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_LIST_ELEM = 1
+)
+
+// nf_tables hook attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_HOOK_HOOKNUM  = 1
+	NFTA_HOOK_PRIORITY = 2
+	NFTA_HOOK_DEV      = 3
+	NFTA_HOOK_DEVS     = 4
+)
+
+// nf_tables table flags, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_TABLE_F_DORMANT = 0x1
+	NFT_TABLE_F_OWNER   = 0x2
+)
+
+// nf_tables table attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_TABLE_NAME     = 1
+	NFTA_TABLE_FLAGS    = 2
+	NFTA_TABLE_USE      = 3
+	NFTA_TABLE_HANDLE   = 4
+	NFTA_TABLE_PAD      = 5
+	NFTA_TABLE_USERDATA = 6
+	NFTA_TABLE_OWNER    = 7
+)
+
+// nf_tables chain flags, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_CHAIN_BASE       = 0x1
+	NFT_CHAIN_HW_OFFLOAD = 0x2
+	NFT_CHAIN_BINDING    = 0x4
+)
+
+// nf_tables chain attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_CHAIN_TABLE    = 1
+	NFTA_CHAIN_HANDLE   = 2
+	NFTA_CHAIN_NAME     = 3
+	NFTA_CHAIN_HOOK     = 4
+	NFTA_CHAIN_POLICY   = 5
+	NFTA_CHAIN_USE      = 6
+	NFTA_CHAIN_TYPE     = 7
+	NFTA_CHAIN_COUNTERS = 8
+	NFTA_CHAIN_PAD      = 9
+	NFTA_CHAIN_FLAGS    = 10
+	NFTA_CHAIN_ID       = 11
+	NFTA_CHAIN_USERDATA = 12
+)
+
+// nf_tables rule attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_RULE_TABLE       = 1
+	NFTA_RULE_CHAIN       = 2
+	NFTA_RULE_HANDLE      = 3
+	NFTA_RULE_EXPRESSIONS = 4
+	NFTA_RULE_COMPAT      = 5
+	NFTA_RULE_POSITION    = 6
+	NFTA_RULE_USERDATA    = 7
+	NFTA_RULE_PAD         = 8
+	NFTA_RULE_ID          = 9
+	NFTA_RULE_POSITION_ID = 10
+	NFTA_RULE_CHAIN_ID    = 11
+)
+
+// nf_tables set flags, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_SET_ANONYMOUS = 0x1
+	NFT_SET_CONSTANT  = 0x2
+	NFT_SET_INTERVAL  = 0x4
+	NFT_SET_MAP       = 0x8
+	NFT_SET_TIMEOUT   = 0x10
+	NFT_SET_EVAL      = 0x20
+	NFT_SET_OBJECT    = 0x40
+	NFT_SET_CONCAT    = 0x80
+	NFT_SET_EXPR      = 0x100
+)
+
+// nf_tables set attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_SET_TABLE       = 1
+	NFTA_SET_NAME        = 2
+	NFTA_SET_FLAGS       = 3
+	NFTA_SET_KEY_TYPE    = 4
+	NFTA_SET_KEY_LEN     = 5
+	NFTA_SET_DATA_TYPE   = 6
+	NFTA_SET_DATA_LEN    = 7
+	NFTA_SET_POLICY      = 8
+	NFTA_SET_DESC        = 9
+	NFTA_SET_ID          = 10
+	NFTA_SET_TIMEOUT     = 11
+	NFTA_SET_GC_INTERVAL = 12
+	NFTA_SET_USERDATA    = 13
+	NFTA_SET_PAD         = 14
+	NFTA_SET_OBJ_TYPE    = 15
+	NFTA_SET_HANDLE      = 16
+	NFTA_SET_EXPR        = 17
+	NFTA_SET_EXPRESSIONS = 18
+)
+
+// nf_tables set element flags, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_SET_ELEM_INTERVAL_END = 0x1
+	NFT_SET_ELEM_CATCHALL     = 0x2
+)
+
+// nf_tables set element attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_SET_ELEM_KEY         = 1
+	NFTA_SET_ELEM_DATA        = 2
+	NFTA_SET_ELEM_FLAGS       = 3
+	NFTA_SET_ELEM_TIMEOUT     = 4
+	NFTA_SET_ELEM_EXPIRATION  = 5
+	NFTA_SET_ELEM_USERDATA    = 6
+	NFTA_SET_ELEM_EXPR        = 7
+	NFTA_SET_ELEM_PAD         = 8
+	NFTA_SET_ELEM_OBJREF      = 9
+	NFTA_SET_ELEM_KEY_END     = 10
+	NFTA_SET_ELEM_EXPRESSIONS = 11
+)
+
+// nf_tables set element list attributes, from
+// uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_SET_ELEM_LIST_TABLE    = 1
+	NFTA_SET_ELEM_LIST_SET      = 2
+	NFTA_SET_ELEM_LIST_ELEMENTS = 3
+	NFTA_SET_ELEM_LIST_SET_ID   = 4
+)
+
+// nf_tables data types, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_DATA_VALUE   = 0
+	NFT_DATA_VERDICT = 0xffffff00
+)
+
+// nf_tables data attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_DATA_VALUE   = 1
+	NFTA_DATA_VERDICT = 2
+)
+
+// nf_tables verdict attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_VERDICT_CODE     = 1
+	NFTA_VERDICT_CHAIN    = 2
+	NFTA_VERDICT_CHAIN_ID = 3
+)
+
+// nf_tables expression attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_EXPR_NAME = 1
+	NFTA_EXPR_DATA = 2
+)
+
+// nf_tables immediate expression attributes, from
+// uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_IMMEDIATE_DREG = 1
+	NFTA_IMMEDIATE_DATA = 2
+)
+
+// nf_tables bitwise operations and attributes, from
+// uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_BITWISE_BOOL = 0
+
+	NFTA_BITWISE_SREG = 1
+	NFTA_BITWISE_DREG = 2
+	NFTA_BITWISE_LEN  = 3
+	NFTA_BITWISE_MASK = 4
+	NFTA_BITWISE_XOR  = 5
+	NFTA_BITWISE_OP   = 6
+	NFTA_BITWISE_DATA = 7
+)
+
+// nf_tables cmp operations and attributes, from
+// uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_CMP_EQ  = 0
+	NFT_CMP_NEQ = 1
+	NFT_CMP_LT  = 2
+	NFT_CMP_LTE = 3
+	NFT_CMP_GT  = 4
+	NFT_CMP_GTE = 5
+
+	NFTA_CMP_SREG = 1
+	NFTA_CMP_OP   = 2
+	NFTA_CMP_DATA = 3
+)
+
+// nf_tables lookup flags and attributes, from
+// uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_LOOKUP_F_INV = 0x1
+
+	NFTA_LOOKUP_SET    = 1
+	NFTA_LOOKUP_SREG   = 2
+	NFTA_LOOKUP_DREG   = 3
+	NFTA_LOOKUP_SET_ID = 4
+	NFTA_LOOKUP_FLAGS  = 5
+)
+
+// nf_tables payload bases and attributes, from
+// uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_PAYLOAD_LL_HEADER        = 0
+	NFT_PAYLOAD_NETWORK_HEADER   = 1
+	NFT_PAYLOAD_TRANSPORT_HEADER = 2
+
+	NFTA_PAYLOAD_DREG        = 1
+	NFTA_PAYLOAD_BASE        = 2
+	NFTA_PAYLOAD_OFFSET      = 3
+	NFTA_PAYLOAD_LEN         = 4
+	NFTA_PAYLOAD_SREG        = 5
+	NFTA_PAYLOAD_CSUM_TYPE   = 6
+	NFTA_PAYLOAD_CSUM_OFFSET = 7
+	NFTA_PAYLOAD_CSUM_FLAGS  = 8
+)
+
+// nf_tables meta keys, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_META_LEN      = 0
+	NFT_META_PROTOCOL = 1
+	NFT_META_PRIORITY = 2
+	NFT_META_MARK     = 3
+	NFT_META_IIF      = 4
+	NFT_META_OIF      = 5
+	NFT_META_IIFNAME  = 6
+	NFT_META_OIFNAME  = 7
+	NFT_META_IIFTYPE  = 8
+	NFT_META_OIFTYPE  = 9
+	NFT_META_NFPROTO  = 15
+	NFT_META_L4PROTO  = 16
+)
+
+// nf_tables meta attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_META_DREG = 1
+	NFTA_META_KEY  = 2
+	NFTA_META_SREG = 3
+)
+
+// nf_tables counter attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_COUNTER_BYTES   = 1
+	NFTA_COUNTER_PACKETS = 2
+	NFTA_COUNTER_PAD     = 3
+)
+
+// nf_tables nat types and attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_NAT_SNAT = 0
+	NFT_NAT_DNAT = 1
+
+	NFTA_NAT_TYPE          = 1
+	NFTA_NAT_FAMILY        = 2
+	NFTA_NAT_REG_ADDR_MIN  = 3
+	NFTA_NAT_REG_ADDR_MAX  = 4
+	NFTA_NAT_REG_PROTO_MIN = 5
+	NFTA_NAT_REG_PROTO_MAX = 6
+	NFTA_NAT_FLAGS         = 7
+)
+
+// nf_tables masq attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_MASQ_FLAGS         = 1
+	NFTA_MASQ_REG_PROTO_MIN = 2
+	NFTA_MASQ_REG_PROTO_MAX = 3
+)
+
+// nf_tables generation attributes, from uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_GEN_ID        = 1
+	NFTA_GEN_PROC_PID  = 2
+	NFTA_GEN_PROC_NAME = 3
+)
@@ -0,0 +1,70 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Execution domains and flags for personality(2), from
+// include/uapi/linux/personality.h.
+const (
+	// UNAME26 makes uname(2) report a 2.6 version of a 3.x or later kernel.
+	UNAME26 = 0x0020000
+
+	// ADDR_NO_RANDOMIZE disables address space layout randomization.
+	ADDR_NO_RANDOMIZE = 0x0040000
+
+	// FDPIC_FUNCPTRS makes signal handlers point to function descriptors.
+	FDPIC_FUNCPTRS = 0x0080000
+
+	// MMAP_PAGE_ZERO maps page 0 as read-only.
+	MMAP_PAGE_ZERO = 0x0100000
+
+	// ADDR_COMPAT_LAYOUT uses the legacy virtual address space layout.
+	ADDR_COMPAT_LAYOUT = 0x0200000
+
+	// READ_IMPLIES_EXEC makes PROT_READ imply PROT_EXEC.
+	READ_IMPLIES_EXEC = 0x0400000
+
+	// ADDR_LIMIT_32BIT limits the address space to 32 bits.
+	ADDR_LIMIT_32BIT = 0x0800000
+
+	// SHORT_INODE is a no-op in Linux.
+	SHORT_INODE = 0x1000000
+
+	// WHOLE_SECONDS is a no-op in Linux.
+	WHOLE_SECONDS = 0x2000000
+
+	// STICKY_TIMEOUTS makes select(2) and friends not update their timeout.
+	STICKY_TIMEOUTS = 0x4000000
+
+	// ADDR_LIMIT_3GB limits the address space to 3GB.
+	ADDR_LIMIT_3GB = 0x8000000
+
+	// PER_CLEAR_ON_SETID are the flags cleared when executing a setuid or
+	// setgid binary.
+	PER_CLEAR_ON_SETID = READ_IMPLIES_EXEC | ADDR_NO_RANDOMIZE | ADDR_COMPAT_LAYOUT | MMAP_PAGE_ZERO
+
+	// PER_LINUX is the standard Linux execution domain.
+	PER_LINUX = 0x0000
+
+	// PER_LINUX32 is the Linux execution domain for 32-bit binaries. On
+	// 64-bit architectures, it makes uname(2) report a 32-bit machine.
+	PER_LINUX32 = 0x0008
+
+	// PER_MASK masks the execution domain of a personality.
+	PER_MASK = 0x00ff
+
+	// PersonalityQuery is the personality(2) argument that queries the
+	// current personality without changing it.
+	PersonalityQuery = 0xffffffff
+)
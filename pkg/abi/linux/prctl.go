@@ -171,3 +171,9 @@ const (
 	SUID_DUMP_USER    = 1
 	SUID_DUMP_ROOT    = 2
 )
+
+// Flags for prctl(PR_SET_TSC), defined in include/uapi/linux/prctl.h.
+const (
+	PR_TSC_ENABLE  = 1
+	PR_TSC_SIGSEGV = 2
+)
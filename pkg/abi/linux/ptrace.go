@@ -45,6 +45,21 @@ const (
 	PTRACE_SECCOMP_GET_METADATA = 0x420d
 )
 
+// PTRACE_PEEKSIGINFO flags from include/uapi/linux/ptrace.h.
+const (
+	PTRACE_PEEKSIGINFO_SHARED = 1 << 0
+)
+
+// PtracePeekSiginfoArgs is struct ptrace_peeksiginfo_args, from
+// include/uapi/linux/ptrace.h.
+//
+// +marshal
+type PtracePeekSiginfoArgs struct {
+	Off   uint64
+	Flags uint32
+	Nr    int32
+}
+
 // ptrace commands from arch/x86/include/uapi/asm/ptrace-abi.h.
 const (
 	PTRACE_GETREGS           = 12
@@ -0,0 +1,154 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Socket options from uapi/linux/sctp.h.
+const (
+	SCTP_RTOINFO                = 0
+	SCTP_ASSOCINFO              = 1
+	SCTP_INITMSG                = 2
+	SCTP_NODELAY                = 3
+	SCTP_AUTOCLOSE              = 4
+	SCTP_SET_PEER_PRIMARY_ADDR  = 5
+	SCTP_PRIMARY_ADDR           = 6
+	SCTP_ADAPTATION_LAYER       = 7
+	SCTP_DISABLE_FRAGMENTS      = 8
+	SCTP_PEER_ADDR_PARAMS       = 9
+	SCTP_DEFAULT_SEND_PARAM     = 10
+	SCTP_EVENTS                 = 11
+	SCTP_I_WANT_MAPPED_V4_ADDR  = 12
+	SCTP_MAXSEG                 = 13
+	SCTP_STATUS                 = 14
+	SCTP_GET_PEER_ADDR_INFO     = 15
+	SCTP_SOCKOPT_BINDX_ADD      = 100
+	SCTP_SOCKOPT_BINDX_REM      = 101
+	SCTP_SOCKOPT_PEELOFF        = 102
+	SCTP_SOCKOPT_CONNECTX_OLD   = 107
+	SCTP_GET_PEER_ADDRS         = 108
+	SCTP_GET_LOCAL_ADDRS        = 109
+	SCTP_SOCKOPT_CONNECTX       = 110
+	SCTP_SOCKOPT_CONNECTX3      = 111
+	SCTP_GET_ASSOC_STATS        = 112
+	SCTP_PR_SUPPORTED           = 113
+	SCTP_DEFAULT_PRINFO         = 114
+	SCTP_PR_ASSOC_STATUS        = 115
+	SCTP_SOCKOPT_PEELOFF_FLAGS  = 122
+	SCTP_STREAM_SCHEDULER       = 123
+	SCTP_STREAM_SCHEDULER_VALUE = 124
+	SCTP_INTERLEAVING_SUPPORTED = 125
+	SCTP_ASCONF_SUPPORTED       = 128
+	SCTP_AUTH_SUPPORTED         = 129
+	SCTP_ECN_SUPPORTED          = 130
+)
+
+// Control message types, from uapi/linux/sctp.h.
+const (
+	SCTP_INIT   = 0
+	SCTP_SNDRCV = 1
+)
+
+// Flags for the Flags field of SCTPSndRcvInfo, from uapi/linux/sctp.h.
+const (
+	SCTP_UNORDERED = 1 << 0
+	SCTP_ADDR_OVER = 1 << 1
+	SCTP_ABORT     = 1 << 2
+	SCTP_EOF       = MSG_FIN
+)
+
+// Association states reported by SCTP_STATUS, from enum sctp_sstat_state in
+// uapi/linux/sctp.h.
+const (
+	SCTP_EMPTY             = 0
+	SCTP_CLOSED            = 1
+	SCTP_COOKIE_WAIT       = 2
+	SCTP_COOKIE_ECHOED     = 3
+	SCTP_ESTABLISHED       = 4
+	SCTP_SHUTDOWN_PENDING  = 5
+	SCTP_SHUTDOWN_SENT     = 6
+	SCTP_SHUTDOWN_RECEIVED = 7
+	SCTP_SHUTDOWN_ACK_SENT = 8
+)
+
+// SizeOfSCTPEventSubscribe is the size of struct sctp_event_subscribe, which
+// holds one byte per event type.
+const SizeOfSCTPEventSubscribe = 14
+
+// SCTPSndRcvInfo is struct sctp_sndrcvinfo, from uapi/linux/sctp.h. It is
+// the payload of SCTP_SNDRCV control messages and of the
+// SCTP_DEFAULT_SEND_PARAM socket option.
+//
+// +marshal
+type SCTPSndRcvInfo struct {
+	Stream     uint16
+	SSN        uint16
+	Flags      uint16
+	_          [2]byte
+	PPID       uint32
+	Context    uint32
+	TimeToLive uint32
+	TSN        uint32
+	CumTSN     uint32
+	AssocID    int32
+}
+
+// SizeOfSCTPSndRcvInfo is the size of an SCTPSndRcvInfo struct.
+const SizeOfSCTPSndRcvInfo = 32
+
+// SCTPInitMsg is struct sctp_initmsg, from uapi/linux/sctp.h. It is the
+// value of the SCTP_INITMSG socket option.
+//
+// +marshal
+type SCTPInitMsg struct {
+	NumOutStreams  uint16
+	MaxInStreams   uint16
+	MaxAttempts    uint16
+	MaxInitTimeout uint16
+}
+
+// SizeOfSCTPInitMsg is the size of an SCTPInitMsg struct.
+const SizeOfSCTPInitMsg = 8
+
+// SCTPPaddrInfo is struct sctp_paddrinfo, from uapi/linux/sctp.h. Linux
+// declares it packed, with 4-byte alignment.
+//
+// +marshal
+type SCTPPaddrInfo struct {
+	AssocID int32
+	Address [SockAddrMax]byte
+	State   int32
+	Cwnd    uint32
+	SRTT    uint32
+	RTO     uint32
+	MTU     uint32
+}
+
+// SCTPStatus is struct sctp_status, from uapi/linux/sctp.h. It is the value
+// of the SCTP_STATUS socket option.
+//
+// +marshal
+type SCTPStatus struct {
+	AssocID            int32
+	State              int32
+	Rwnd               uint32
+	UnackData          uint16
+	PendData           uint16
+	InStreams          uint16
+	OutStreams         uint16
+	FragmentationPoint uint32
+	Primary            SCTPPaddrInfo
+}
+
+// SizeOfSCTPStatus is the size of an SCTPStatus struct.
+const SizeOfSCTPStatus = 176
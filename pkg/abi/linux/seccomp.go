@@ -26,8 +26,16 @@ const (
 	SECCOMP_RET_DATA        = 0x0000ffff
 
 	SECCOMP_SET_MODE_FILTER   = 1
-	SECCOMP_FILTER_FLAG_TSYNC = 1
 	SECCOMP_GET_ACTION_AVAIL  = 2
+	SECCOMP_GET_NOTIF_SIZES   = 3
+	SECCOMP_FILTER_FLAG_TSYNC = 1
+
+	SECCOMP_FILTER_FLAG_NEW_LISTENER = 1 << 3
+
+	SECCOMP_USER_NOTIF_FLAG_CONTINUE = 1 << 0
+
+	SECCOMP_ADDFD_FLAG_SETFD = 1 << 0
+	SECCOMP_ADDFD_FLAG_SEND  = 1 << 1
 )
 
 // BPFAction is an action for a BPF filter.
@@ -39,7 +47,9 @@ const (
 	SECCOMP_RET_KILL_THREAD  BPFAction = 0x00000000
 	SECCOMP_RET_TRAP         BPFAction = 0x00030000
 	SECCOMP_RET_ERRNO        BPFAction = 0x00050000
+	SECCOMP_RET_USER_NOTIF   BPFAction = 0x7fc00000
 	SECCOMP_RET_TRACE        BPFAction = 0x7ff00000
+	SECCOMP_RET_LOG          BPFAction = 0x7ffc0000
 	SECCOMP_RET_ALLOW        BPFAction = 0x7fff0000
 )
 
@@ -53,8 +63,12 @@ func (a BPFAction) String() string {
 		return fmt.Sprintf("trap (%d)", a.Data())
 	case SECCOMP_RET_ERRNO:
 		return fmt.Sprintf("errno (%d)", a.Data())
+	case SECCOMP_RET_USER_NOTIF:
+		return "user notif"
 	case SECCOMP_RET_TRACE:
 		return fmt.Sprintf("trace (%d)", a.Data())
+	case SECCOMP_RET_LOG:
+		return "log"
 	case SECCOMP_RET_ALLOW:
 		return "allow"
 	}
@@ -104,3 +118,80 @@ type SeccompData struct {
 	// Args contains the first 6 system call arguments.
 	Args [6]uint64
 }
+
+// SeccompNotif is equivalent to struct seccomp_notif.
+//
+// +marshal
+type SeccompNotif struct {
+	// ID is the cookie identifying the notification.
+	ID uint64
+
+	// Pid is the thread ID of the task that triggered the notification.
+	Pid uint32
+
+	// Flags is currently unused and always zero.
+	Flags uint32
+
+	// Data is the system call that triggered the notification.
+	Data SeccompData
+}
+
+// SeccompNotifResp is equivalent to struct seccomp_notif_resp.
+//
+// +marshal
+type SeccompNotifResp struct {
+	// ID is the cookie of the notification being responded to.
+	ID uint64
+
+	// Val is the return value of the system call, if Error is zero.
+	Val int64
+
+	// Error is the negated errno returned by the system call, or zero.
+	Error int32
+
+	// Flags is a combination of SECCOMP_USER_NOTIF_FLAG_*.
+	Flags uint32
+}
+
+// SeccompNotifAddFD is equivalent to struct seccomp_notif_addfd.
+//
+// +marshal
+type SeccompNotifAddFD struct {
+	// ID is the cookie of the notification whose task receives the file.
+	ID uint64
+
+	// Flags is a combination of SECCOMP_ADDFD_FLAG_*.
+	Flags uint32
+
+	// SrcFD is the file descriptor of the supervisor to install.
+	SrcFD uint32
+
+	// NewFD is the file descriptor number to use in the target task, if
+	// SECCOMP_ADDFD_FLAG_SETFD is set.
+	NewFD uint32
+
+	// NewFDFlags is a combination of O_CLOEXEC to set on the new file
+	// descriptor.
+	NewFDFlags uint32
+}
+
+// SeccompNotifSizes is equivalent to struct seccomp_notif_sizes.
+//
+// +marshal
+type SeccompNotifSizes struct {
+	Notif     uint16
+	NotifResp uint16
+	Data      uint16
+}
+
+// Seccomp user notification ioctls from <linux/seccomp.h>.
+var (
+	SECCOMP_IOCTL_NOTIF_RECV     = IOC(_IOC_READ|_IOC_WRITE, '!', 0, 80)
+	SECCOMP_IOCTL_NOTIF_SEND     = IOC(_IOC_READ|_IOC_WRITE, '!', 1, 24)
+	SECCOMP_IOCTL_NOTIF_ID_VALID = IOC(_IOC_WRITE, '!', 2, 8)
+	SECCOMP_IOCTL_NOTIF_ADDFD    = IOC(_IOC_WRITE, '!', 3, 24)
+
+	// SECCOMP_IOCTL_NOTIF_ID_VALID_WRONG_DIR is the original, incorrect
+	// encoding of SECCOMP_IOCTL_NOTIF_ID_VALID, which is still accepted.
+	SECCOMP_IOCTL_NOTIF_ID_VALID_WRONG_DIR = IOC(_IOC_READ, '!', 2, 8)
+)
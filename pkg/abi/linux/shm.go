@@ -34,10 +34,11 @@ const (
 
 // Additional Linux-only flags for shmctl(2). Source: include/uapi/linux/shm.h
 const (
-	SHM_LOCK   = 11
-	SHM_UNLOCK = 12
-	SHM_STAT   = 13
-	SHM_INFO   = 14
+	SHM_LOCK     = 11
+	SHM_UNLOCK   = 12
+	SHM_STAT     = 13
+	SHM_INFO     = 14
+	SHM_STAT_ANY = 15
 )
 
 // SHM defaults as specified by linux. Source: include/uapi/linux/shm.h
@@ -98,6 +98,7 @@ const (
 	SOL_UDP     = 17
 	SOL_IPV6    = 41
 	SOL_ICMPV6  = 58
+	SOL_SCTP    = 132
 	SOL_RAW     = 255
 	SOL_PACKET  = 263
 	SOL_NETLINK = 270
@@ -331,6 +332,7 @@ func (s *SockAddrInet6) implementsSockAddr()   {}
 func (s *SockAddrLink) implementsSockAddr()    {}
 func (s *SockAddrUnix) implementsSockAddr()    {}
 func (s *SockAddrNetlink) implementsSockAddr() {}
+func (s *SockAddrVM) implementsSockAddr()      {}
 
 // Linger is struct linger, from include/linux/socket.h.
 //
@@ -343,6 +345,44 @@ type Linger struct {
 // SizeOfLinger is the binary size of a Linger struct.
 const SizeOfLinger = 8
 
+// Timestamping flags for SO_TIMESTAMPING, from
+// include/uapi/linux/net_tstamp.h.
+const (
+	SOF_TIMESTAMPING_TX_HARDWARE   = 1 << 0
+	SOF_TIMESTAMPING_TX_SOFTWARE   = 1 << 1
+	SOF_TIMESTAMPING_RX_HARDWARE   = 1 << 2
+	SOF_TIMESTAMPING_RX_SOFTWARE   = 1 << 3
+	SOF_TIMESTAMPING_SOFTWARE      = 1 << 4
+	SOF_TIMESTAMPING_SYS_HARDWARE  = 1 << 5
+	SOF_TIMESTAMPING_RAW_HARDWARE  = 1 << 6
+	SOF_TIMESTAMPING_OPT_ID        = 1 << 7
+	SOF_TIMESTAMPING_TX_SCHED      = 1 << 8
+	SOF_TIMESTAMPING_TX_ACK        = 1 << 9
+	SOF_TIMESTAMPING_OPT_CMSG      = 1 << 10
+	SOF_TIMESTAMPING_OPT_TSONLY    = 1 << 11
+	SOF_TIMESTAMPING_OPT_STATS     = 1 << 12
+	SOF_TIMESTAMPING_OPT_PKTINFO   = 1 << 13
+	SOF_TIMESTAMPING_OPT_TX_SWHW   = 1 << 14
+	SOF_TIMESTAMPING_BIND_PHC      = 1 << 15
+	SOF_TIMESTAMPING_OPT_ID_TCP    = 1 << 16
+	SOF_TIMESTAMPING_OPT_RX_FILTER = 1 << 17
+
+	SOF_TIMESTAMPING_LAST = SOF_TIMESTAMPING_OPT_RX_FILTER
+	SOF_TIMESTAMPING_MASK = (SOF_TIMESTAMPING_LAST - 1) | SOF_TIMESTAMPING_LAST
+)
+
+// SoTimestamping is struct so_timestamping, from
+// include/uapi/linux/net_tstamp.h.
+//
+// +marshal
+type SoTimestamping struct {
+	Flags   int32
+	BindPHC int32
+}
+
+// SizeOfSoTimestamping is the binary size of a SoTimestamping struct.
+const SizeOfSoTimestamping = 8
+
 // TCPInfo is a collection of TCP statistics.
 //
 // From uapi/linux/tcp.h. Newer versions of Linux continue to add new fields to
@@ -500,8 +540,9 @@ var SizeOfTCPInfo = (*TCPInfo)(nil).SizeBytes()
 
 // Control message types, from linux/socket.h.
 const (
-	SCM_CREDENTIALS = 0x2
-	SCM_RIGHTS      = 0x1
+	SCM_CREDENTIALS  = 0x2
+	SCM_RIGHTS       = 0x1
+	SCM_TIMESTAMPING = SO_TIMESTAMPING
 )
 
 // A ControlMessageHeader is the header for a socket control message.
@@ -551,6 +592,21 @@ type ControlMessageIPv6PacketInfo struct {
 	NIC  uint32
 }
 
+// ControlMessageTimestamping is an SCM_TIMESTAMPING socket control message.
+//
+// ControlMessageTimestamping represents struct scm_timestamping from
+// include/uapi/linux/errqueue.h. Ts[0] holds the software timestamp; Ts[2]
+// would hold a raw hardware timestamp, which is never generated.
+//
+// +marshal
+type ControlMessageTimestamping struct {
+	Ts [3]Timespec
+}
+
+// SizeOfControlMessageTimestamping is the binary size of a
+// ControlMessageTimestamping struct.
+var SizeOfControlMessageTimestamping = (*ControlMessageTimestamping)(nil).SizeBytes()
+
 // SizeOfControlMessageCredentials is the binary size of a
 // ControlMessageCredentials struct.
 var SizeOfControlMessageCredentials = (*ControlMessageCredentials)(nil).SizeBytes()
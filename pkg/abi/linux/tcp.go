@@ -68,3 +68,47 @@ const (
 	TCP_CA_Recovery = 3
 	TCP_CA_Loss     = 4
 )
+
+// Flags for tcp_info.tcpi_options, from include/uapi/linux/tcp.h.
+const (
+	TCPI_OPT_TIMESTAMPS = 1
+	TCPI_OPT_SACK       = 2
+	TCPI_OPT_WSCALE     = 4
+	TCPI_OPT_ECN        = 8
+	TCPI_OPT_ECN_SEEN   = 16
+	TCPI_OPT_SYN_DATA   = 32
+)
+
+// Constants for struct tcp_md5sig, from include/uapi/linux/tcp.h.
+const (
+	TCP_MD5SIG_MAXKEYLEN    = 80
+	TCP_MD5SIG_FLAG_PREFIX  = 0x1
+	TCP_MD5SIG_FLAG_IFINDEX = 0x2
+)
+
+// TCPMD5Sig is struct tcp_md5sig, from include/uapi/linux/tcp.h. It is the
+// argument of the TCP_MD5SIG and TCP_MD5SIG_EXT socket options.
+//
+// +marshal
+type TCPMD5Sig struct {
+	// Addr is the peer's address, as a struct sockaddr_storage.
+	Addr [SockAddrMax]byte
+
+	// Flags are TCP_MD5SIG_FLAG_* flags. They are only used by
+	// TCP_MD5SIG_EXT.
+	Flags uint8
+
+	// PrefixLen is the length of the address prefix that peers must match
+	// if Flags contains TCP_MD5SIG_FLAG_PREFIX.
+	PrefixLen uint8
+
+	// KeyLen is the length of Key. A KeyLen of 0 deletes the key.
+	KeyLen uint16
+
+	// IfIndex is the index of the device the key is bound to if Flags
+	// contains TCP_MD5SIG_FLAG_IFINDEX.
+	IfIndex int32
+
+	// Key is the key.
+	Key [TCP_MD5SIG_MAXKEYLEN]byte
+}
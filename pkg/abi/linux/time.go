@@ -77,6 +77,10 @@ const (
 	TIMER_ABSTIME = 1
 )
 
+// KTIME_SEC_MAX is the largest number of seconds representable by the kernel's
+// ktime_t, from include/vdso/time64.h.
+const KTIME_SEC_MAX = math.MaxInt64 / 1000000000
+
 // Flags for timerfd syscalls (timerfd_create(2), timerfd_settime(2)).
 const (
 	// TFD_CLOEXEC is a timerfd_create flag.
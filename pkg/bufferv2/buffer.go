@@ -479,7 +479,8 @@ func (b *Buffer) Merge(other *Buffer) {
 }
 
 // WriteFromReader writes to the buffer from an io.Reader. A maximum read size
-// of MaxChunkSize is enforced to prevent allocating views from the heap.
+// of MaxChunkSize is enforced to prevent allocating views from the heap. Fewer
+// than count bytes are written if r reaches EOF first.
 func (b *Buffer) WriteFromReader(r io.Reader, count int64) (int64, error) {
 	var done int64
 	for done < count {
@@ -492,12 +493,14 @@ func (b *Buffer) WriteFromReader(r io.Reader, count int64) (int64, error) {
 		n, err := io.Copy(v, &lr)
 		b.Append(v)
 		done += n
-		if err == io.EOF {
-			break
-		}
 		if err != nil {
 			return done, err
 		}
+		// io.Copy only returns a short count without an error if r reached
+		// EOF.
+		if n < vsize {
+			break
+		}
 	}
 	return done, nil
 }
@@ -650,6 +650,21 @@ func TestReadFromLargeWriter(t *testing.T) {
 	}
 }
 
+func TestWriteFromReaderEOF(t *testing.T) {
+	data := make([]byte, MaxChunkSize+1)
+	b := Buffer{}
+	n, err := b.WriteFromReader(bytes.NewReader(data), 4*MaxChunkSize)
+	if err != nil {
+		t.Fatalf("b.WriteFromReader() failed: want err=nil, got %v", err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("got b.WriteFromReader()=%d, want %d", n, len(data))
+	}
+	if b.Size() != int64(len(data)) {
+		t.Errorf("got b.Size()=%d, want %d", b.Size(), len(data))
+	}
+}
+
 func TestRead(t *testing.T) {
 	readStrings := []string{"abcdef", "123456", "ghijkl"}
 	totalSize := len(readStrings) * len(readStrings[0])
@@ -17,6 +17,7 @@ package lisafs
 import (
 	"fmt"
 	"math"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/cleanup"
@@ -25,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/unet"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 const (
@@ -66,6 +68,47 @@ type Client struct {
 	// checkpoint/restore as FDIDs are not preserved.
 	fdsMu      sync.Mutex
 	fdsToClose []FDID
+
+	// reconnectTimeout is the maximum time for which RPCs wait for a lost
+	// connection to be re-established with Reconnect. If it is 0, the client
+	// doesn't survive the loss of its connection. reconnectTimeout and
+	// onDisconnect are set by EnableReconnect before the client is used, and
+	// are immutable thereafter.
+	reconnectTimeout time.Duration
+	onDisconnect     func()
+
+	// reconnectMu serializes Reconnect and Close.
+	reconnectMu sync.Mutex
+
+	// connMu protects the connection state below, and the FD tracking state
+	// in reconnect.go.
+	connMu sync.Mutex
+
+	// lost is true if the connection to the server has been lost and
+	// Reconnect hasn't been called yet. RPCs on ClientFDs are parked while
+	// lost is true.
+	lost bool
+
+	// closed is true after Close has been called.
+	closed bool
+
+	// generation is incremented every time the client reconnects. ClientFDs
+	// created on previous connections are re-derived on the current one on
+	// first use.
+	generation uint64
+
+	// connQueue is notified when lost becomes false.
+	connQueue waiter.Queue
+
+	// root is the mount root FD of the current connection. It is only kept
+	// open if reconnection is enabled, since it is needed to re-derive
+	// ClientFDs after a reconnect.
+	root FDID
+
+	// origins and stale track how FDs were obtained. See reconnect.go.
+	origins map[FDID]*fdOrigin
+	stale   map[fdKey]*fdOrigin
+	remap   map[fdKey]fdKey
 }
 
 // NewClient creates a new client for communication with the server. It mounts
@@ -73,14 +116,29 @@ type Client struct {
 // the passed socket. On success, it returns the initialized client along with
 // the root Inode.
 func NewClient(sock *unet.Socket) (*Client, Inode, error) {
-	maxChans := maxChannels()
 	c := &Client{
-		sockComm:          newSockComm(sock),
-		channels:          make([]*channel, 0, maxChans),
-		availableChannels: make([]*channel, 0, maxChans),
-		maxMessageSize:    1 << 20, // 1 MB for now.
-		fdsToClose:        make([]FDID, 0, fdsToCloseBatchSize),
+		maxMessageSize: 1 << 20, // 1 MB for now.
+		fdsToClose:     make([]FDID, 0, fdsToCloseBatchSize),
+	}
+	root, err := c.connect(sock, true /* first */)
+	if err != nil {
+		return nil, Inode{}, err
 	}
+	return c, root, nil
+}
+
+// connect establishes a connection with the server over sock. It mounts the
+// server and creates channels for fast IPC. If first is false, the server
+// must support the same messages as the server of the previous connection.
+func (c *Client) connect(sock *unet.Socket, first bool) (Inode, error) {
+	maxChans := maxChannels()
+	c.sockMu.Lock()
+	c.sockComm = newSockComm(sock)
+	c.sockMu.Unlock()
+	c.channelsMu.Lock()
+	c.channels = make([]*channel, 0, maxChans)
+	c.availableChannels = make([]*channel, 0, maxChans)
+	c.channelsMu.Unlock()
 
 	// Start a goroutine to check socket health. This goroutine is also
 	// responsible for client cleanup.
@@ -89,33 +147,46 @@ func NewClient(sock *unet.Socket) (*Client, Inode, error) {
 
 	// Clean everything up if anything fails.
 	cu := cleanup.Make(func() {
-		c.Close()
+		c.sockComm.shutdown()
+		c.watchdogWg.Wait()
 	})
 	defer cu.Clean()
 
-	// Mount the server first. Assume Mount is supported so that we can make the
-	// Mount RPC below.
-	c.supported = make([]bool, Mount+1)
-	c.supported[Mount] = true
 	var (
 		mountReq  MountReq
 		mountResp MountResp
 	)
-	if err := c.SndRcvMessage(Mount, uint32(mountReq.SizeBytes()), mountReq.MarshalBytes, mountResp.CheckedUnmarshal, nil, mountReq.String, mountResp.String); err != nil {
-		return nil, Inode{}, err
-	}
+	if first {
+		// Mount the server first. Assume Mount is supported so that we can
+		// make the Mount RPC below.
+		c.supported = make([]bool, Mount+1)
+		c.supported[Mount] = true
+		if err := c.SndRcvMessage(Mount, uint32(mountReq.SizeBytes()), mountReq.MarshalBytes, mountResp.CheckedUnmarshal, nil, mountReq.String, mountResp.String); err != nil {
+			return Inode{}, err
+		}
 
-	// Initialize client.
-	c.maxMessageSize = uint32(mountResp.MaxMessageSize)
-	var maxSuppMID MID
-	for _, suppMID := range mountResp.SupportedMs {
-		if suppMID > maxSuppMID {
-			maxSuppMID = suppMID
+		// Initialize client.
+		c.maxMessageSize = uint32(mountResp.MaxMessageSize)
+		var maxSuppMID MID
+		for _, suppMID := range mountResp.SupportedMs {
+			if suppMID > maxSuppMID {
+				maxSuppMID = suppMID
+			}
+		}
+		c.supported = make([]bool, maxSuppMID+1)
+		for _, suppMID := range mountResp.SupportedMs {
+			c.supported[suppMID] = true
+		}
+	} else {
+		// c.supported and c.maxMessageSize are read without synchronization,
+		// so they can't change. The new server is expected to be the same
+		// binary as the old one anyway.
+		if err := c.SndRcvMessage(Mount, uint32(mountReq.SizeBytes()), mountReq.MarshalBytes, mountResp.CheckedUnmarshal, nil, mountReq.String, mountResp.String); err != nil {
+			return Inode{}, err
+		}
+		if err := c.checkSameServer(&mountResp); err != nil {
+			return Inode{}, err
 		}
-	}
-	c.supported = make([]bool, maxSuppMID+1)
-	for _, suppMID := range mountResp.SupportedMs {
-		c.supported[suppMID] = true
 	}
 
 	// Create channels parallely so that channels can be used to create more
@@ -150,11 +221,11 @@ func NewClient(sock *unet.Socket) (*Client, Inode, error) {
 	c.channelsMu.Unlock()
 	if maxChans > 0 && numChannels == 0 {
 		log.Warningf("all channel RPCs failed")
-		return nil, Inode{}, unix.ENOMEM
+		return Inode{}, unix.ENOMEM
 	}
 
 	cu.Release()
-	return c, mountResp.Root, nil
+	return mountResp.Root, nil
 }
 
 func (c *Client) watchdog() {
@@ -194,6 +265,8 @@ func (c *Client) watchdog() {
 
 	// Close main socket.
 	c.sockComm.destroy()
+
+	c.connectionLost()
 }
 
 func (c *Client) shutdownActiveChans() {
@@ -218,10 +291,20 @@ func (c *Client) shutdownActiveChans() {
 
 // Close shuts down the main socket and waits for the watchdog to clean up.
 func (c *Client) Close() {
-	// This shutdown has no effect if the watchdog has already fired and closed
-	// the main socket.
-	c.sockComm.shutdown()
+	c.reconnectMu.Lock()
+	defer c.reconnectMu.Unlock()
+	c.connMu.Lock()
+	c.closed = true
+	lost := c.lost
+	c.connMu.Unlock()
+	if !lost {
+		// This shutdown has no effect if the watchdog has already fired and
+		// closed the main socket.
+		c.sockComm.shutdown()
+	}
 	c.watchdogWg.Wait()
+	// Wake up RPCs waiting for a reconnect, which won't happen anymore.
+	c.connQueue.Notify(waiter.EventIn)
 }
 
 func (c *Client) createChannel() (*channel, error) {
@@ -270,6 +353,11 @@ func (c *Client) IsSupported(m MID) bool {
 // RPC to close all the accumulated FDs-to-close. If flush is true, the RPC
 // is made immediately.
 func (c *Client) CloseFD(ctx context.Context, fd FDID, flush bool) {
+	if c.reconnectTimeout > 0 && !c.untrack(fd) {
+		// fd belongs to a lost connection, or is the mount root which is
+		// needed to re-derive FDs after a reconnect.
+		return
+	}
 	c.fdsMu.Lock()
 	c.fdsToClose = append(c.fdsToClose, fd)
 	if !flush && len(c.fdsToClose) < fdsToCloseBatchSize {
@@ -311,6 +399,56 @@ func (c *Client) SyncFDs(ctx context.Context, fds []FDID) error {
 	return err
 }
 
+// Delegate makes the Delegate RPC to request delegations on the passed
+// directory FDs, and returns the FDs on which delegations were granted.
+func (c *Client) Delegate(ctx context.Context, fds []FDID) ([]FDID, error) {
+	if len(fds) == 0 {
+		return nil, nil
+	}
+	req := DelegateReq{FDs: fds}
+	var resp DelegateResp
+	ctx.UninterruptibleSleepStart(false)
+	err := c.SndRcvMessage(Delegate, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return resp.FDs, err
+}
+
+// WatchRecalls dedicates a channel to receiving delegation recalls from the
+// server and, until the client is closed, calls recall from a separate
+// goroutine with the FDs whose delegations were recalled. When the client is
+// closed, recall is called one last time with a nil slice, since none of the
+// delegations can be relied upon anymore.
+//
+// WatchRecalls returns false if the server doesn't support delegations or no
+// channel is available. The client must not rely on delegations in that case.
+func (c *Client) WatchRecalls(recall func(fds []FDID)) bool {
+	if !c.IsSupported(Delegate) || !c.IsSupported(WaitRecall) {
+		return false
+	}
+	// WaitRecall blocks until the server recalls a delegation, so it can't be
+	// made on the main socket without stalling all other RPCs.
+	ch := c.getChannel()
+	if ch == nil {
+		return false
+	}
+	go func() {
+		defer c.releaseChannel(ch)
+		for {
+			var (
+				req  WaitRecallReq
+				resp WaitRecallResp
+			)
+			if err := c.sndRcvMessage(ch, WaitRecall, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String); err != nil {
+				log.Debugf("lisafs: WaitRecall failed, dropping all delegations: %v", err)
+				recall(nil)
+				return
+			}
+			recall(resp.FDs)
+		}
+	}()
+	return true
+}
+
 // SndRcvMessage invokes reqMarshal to marshal the request onto the payload
 // buffer, wakes up the server to process the request, waits for the response
 // and invokes respUnmarshal with the response payload. respFDs is populated
@@ -334,10 +472,42 @@ func (c *Client) SndRcvMessage(m MID, payloadLen uint32, reqMarshal marshalFunc,
 		return unix.EINVAL
 	}
 
+	start := rpcStart()
+	defer rpcDone(m, start, reqString)
+
+	var (
+		gen       uint64
+		connected bool
+	)
+	if c.reconnectTimeout > 0 {
+		c.connMu.Lock()
+		gen, connected = c.generation, !c.lost
+		c.connMu.Unlock()
+	}
+
 	// Acquire a communicator.
 	comm := c.acquireCommunicator()
-	defer c.releaseCommunicator(comm)
+	err := c.sndRcvMessage(comm, m, payloadLen, reqMarshal, respUnmarshal, respFDs, reqString, respString)
+	c.releaseCommunicator(comm)
+	if _, ok := err.(transportError); ok {
+		if connected {
+			// The connection was lost while the RPC was in flight. The server
+			// may or may not have processed it, so it can't be replayed; but
+			// don't let the caller retry before the connection is back.
+			c.awaitReconnectUninterruptible(gen)
+			return unix.EINTR
+		}
+		return err.(transportError).err
+	}
+	return err
+}
 
+// sndRcvMessage is the same as SndRcvMessage, except that the RPC is made on
+// the passed communicator and the message is not validated.
+//
+// Precondition: comm must be held by the caller.
+func (c *Client) sndRcvMessage(comm Communicator, m MID, payloadLen uint32, reqMarshal marshalFunc, respUnmarshal unmarshalFunc, respFDs []int, reqString debugStringer, respString debugStringer) error {
+	wantFDs := len(respFDs)
 	debugf("send", comm, reqString)
 
 	// Marshal the request into comm's payload buffer and make the RPC.
@@ -364,7 +534,7 @@ func (c *Client) SndRcvMessage(m MID, payloadLen uint32, reqMarshal marshalFunc,
 	// Error cases.
 	if err != nil {
 		closeFDs(respFDs)
-		return err
+		return transportError{err}
 	}
 	if respPayloadLen > c.maxMessageSize {
 		log.Warningf("server response for message %d is too large: %d bytes", respM, respPayloadLen)
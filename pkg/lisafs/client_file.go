@@ -30,9 +30,15 @@ import (
 type ClientFD struct {
 	fd     FDID
 	client *Client
+
+	// gen is the Client.generation of the connection on which fd was
+	// obtained.
+	gen uint64
 }
 
-// ID returns the underlying FDID.
+// ID returns the underlying FDID. If the client has reconnected since f was
+// created, the FDID is only meaningful when compared with other FDIDs; see
+// CurrentID.
 func (f *ClientFD) ID() FDID {
 	return f.fd
 }
@@ -47,7 +53,32 @@ func (c *Client) NewFD(fd FDID) ClientFD {
 	return ClientFD{
 		client: c,
 		fd:     fd,
+		gen:    c.currentGeneration(),
+	}
+}
+
+// CurrentID returns the FDID that represents f on the current connection, and
+// true if it is known without making RPCs. This is the case unless the client
+// has reconnected since f was created, and f hasn't been used since.
+func (f *ClientFD) CurrentID() (FDID, bool) {
+	return f.client.peek(f.key())
+}
+
+// key returns the fdKey of f.
+func (f *ClientFD) key() fdKey {
+	return fdKey{gen: f.gen, fd: f.fd}
+}
+
+// currentFD returns the FDID that represents f on the current connection. If
+// the connection has been lost, it waits for the client to reconnect. If the
+// client has reconnected since f was created, the file is looked up again on
+// the new connection; this fails with ESTALE if it no longer exists or has
+// been replaced by a different file.
+func (f *ClientFD) currentFD(ctx context.Context) (FDID, error) {
+	if f.client.reconnectTimeout == 0 {
+		return f.fd, nil
 	}
+	return f.client.resolve(ctx, f.key())
 }
 
 // Ok returns true if the underlying FD is ok.
@@ -60,28 +91,41 @@ func (f *ClientFD) Ok() bool {
 // the Close RPC is made immediately. Consider setting flush to false if
 // closing this FD on remote right away is not critical.
 func (f *ClientFD) Close(ctx context.Context, flush bool) {
-	f.client.CloseFD(ctx, f.fd, flush)
+	if fd, ok := f.client.forget(f.key()); ok {
+		f.client.CloseFD(ctx, fd, flush)
+	}
 	f.fd = InvalidFDID
 }
 
 // OpenAt makes the OpenAt RPC.
 func (f *ClientFD) OpenAt(ctx context.Context, flags uint32) (FDID, int, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return InvalidFDID, -1, err
+	}
 	req := OpenAtReq{
-		FD:    f.fd,
+		FD:    fd,
 		Flags: flags,
 	}
 	var respFD [1]int
 	var resp OpenAtResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(OpenAt, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, respFD[:], req.String, resp.String)
+	err = f.client.SndRcvMessage(OpenAt, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, respFD[:], req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
+	if err == nil {
+		f.client.trackOpen(fd, resp.OpenFD, flags)
+	}
 	return resp.OpenFD, respFD[0], err
 }
 
 // OpenCreateAt makes the OpenCreateAt RPC.
 func (f *ClientFD) OpenCreateAt(ctx context.Context, name string, flags uint32, mode linux.FileMode, uid UID, gid GID) (Inode, FDID, int, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return Inode{}, InvalidFDID, -1, err
+	}
 	var req OpenCreateAtReq
-	req.DirFD = f.fd
+	req.DirFD = fd
 	req.Name = SizedString(name)
 	req.Flags = primitive.Uint32(flags)
 	req.Mode = mode
@@ -91,26 +135,60 @@ func (f *ClientFD) OpenCreateAt(ctx context.Context, name string, flags uint32,
 	var respFD [1]int
 	var resp OpenCreateAtResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(OpenCreateAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, respFD[:], req.String, resp.String)
+	err = f.client.SndRcvMessage(OpenCreateAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, respFD[:], req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	if err == nil {
+		f.client.trackChild(fd, name, &resp.Child)
+		f.client.trackOpen(resp.Child.ControlFD, resp.NewFD, flags)
+	}
+	return resp.Child, resp.NewFD, respFD[0], err
+}
+
+// OpenTmpfileAt makes the OpenTmpfileAt RPC.
+func (f *ClientFD) OpenTmpfileAt(ctx context.Context, flags uint32, mode linux.FileMode, uid UID, gid GID) (Inode, FDID, int, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return Inode{}, InvalidFDID, -1, err
+	}
+	req := OpenTmpfileAtReq{
+		DirFD: fd,
+		UID:   uid,
+		GID:   gid,
+		Mode:  mode,
+		Flags: flags,
+	}
+
+	var respFD [1]int
+	var resp OpenTmpfileAtResp
+	ctx.UninterruptibleSleepStart(false)
+	err = f.client.SndRcvMessage(OpenTmpfileAt, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, respFD[:], req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return resp.Child, resp.NewFD, respFD[0], err
 }
 
 // StatTo makes the Fstat RPC and populates stat with the result.
 func (f *ClientFD) StatTo(ctx context.Context, stat *linux.Statx) error {
-	req := StatReq{FD: f.fd}
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return err
+	}
+	req := StatReq{FD: fd}
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(FStat, uint32(req.SizeBytes()), req.MarshalUnsafe, stat.CheckedUnmarshal, nil, req.String, stat.String)
+	err = f.client.SndRcvMessage(FStat, uint32(req.SizeBytes()), req.MarshalUnsafe, stat.CheckedUnmarshal, nil, req.String, stat.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return err
 }
 
 // Sync makes the Fsync RPC.
 func (f *ClientFD) Sync(ctx context.Context) error {
-	req := FsyncReq{FDs: []FDID{f.fd}}
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return err
+	}
+	req := FsyncReq{FDs: []FDID{fd}}
 	var resp FsyncResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(FSync, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(FSync, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return err
 }
@@ -155,6 +233,10 @@ func chunkify(chunkSize uint64, buf []byte, fn func([]byte, uint64) (uint64, err
 
 // Read makes the PRead RPC.
 func (f *ClientFD) Read(ctx context.Context, dst []byte, offset uint64) (uint64, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return 0, err
+	}
 	var resp PReadResp
 	// maxDataReadSize represents the maximum amount of data we can read at once
 	// (maximum message size - metadata size present in resp). Uninitialized
@@ -164,7 +246,7 @@ func (f *ClientFD) Read(ctx context.Context, dst []byte, offset uint64) (uint64,
 	return chunkify(maxDataReadSize, dst, func(buf []byte, curOff uint64) (uint64, error) {
 		req := PReadReq{
 			Offset: offset + curOff,
-			FD:     f.fd,
+			FD:     fd,
 			Count:  uint32(len(buf)),
 		}
 
@@ -193,6 +275,10 @@ func (f *ClientFD) Read(ctx context.Context, dst []byte, offset uint64) (uint64,
 
 // Write makes the PWrite RPC.
 func (f *ClientFD) Write(ctx context.Context, src []byte, offset uint64) (uint64, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return 0, err
+	}
 	var req PWriteReq
 	// maxDataWriteSize represents the maximum amount of data we can write at
 	// once (maximum message size - metadata size present in req). Uninitialized
@@ -202,7 +288,7 @@ func (f *ClientFD) Write(ctx context.Context, src []byte, offset uint64) (uint64
 	return chunkify(maxDataWriteSize, src, func(buf []byte, curOff uint64) (uint64, error) {
 		req = PWriteReq{
 			Offset:   primitive.Uint64(offset + curOff),
-			FD:       f.fd,
+			FD:       fd,
 			NumBytes: primitive.Uint32(len(buf)),
 			Buf:      buf,
 		}
@@ -217,8 +303,12 @@ func (f *ClientFD) Write(ctx context.Context, src []byte, offset uint64) (uint64
 
 // MkdirAt makes the MkdirAt RPC.
 func (f *ClientFD) MkdirAt(ctx context.Context, name string, mode linux.FileMode, uid UID, gid GID) (Inode, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return Inode{}, err
+	}
 	var req MkdirAtReq
-	req.DirFD = f.fd
+	req.DirFD = fd
 	req.Name = SizedString(name)
 	req.Mode = mode
 	req.UID = uid
@@ -226,15 +316,22 @@ func (f *ClientFD) MkdirAt(ctx context.Context, name string, mode linux.FileMode
 
 	var resp MkdirAtResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(MkdirAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(MkdirAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
+	if err == nil {
+		f.client.trackChild(fd, name, &resp.ChildDir)
+	}
 	return resp.ChildDir, err
 }
 
 // SymlinkAt makes the SymlinkAt RPC.
 func (f *ClientFD) SymlinkAt(ctx context.Context, name, target string, uid UID, gid GID) (Inode, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return Inode{}, err
+	}
 	req := SymlinkAtReq{
-		DirFD:  f.fd,
+		DirFD:  fd,
 		Name:   SizedString(name),
 		Target: SizedString(target),
 		UID:    uid,
@@ -243,30 +340,52 @@ func (f *ClientFD) SymlinkAt(ctx context.Context, name, target string, uid UID,
 
 	var resp SymlinkAtResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(SymlinkAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(SymlinkAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
+	if err == nil {
+		f.client.trackChild(fd, name, &resp.Symlink)
+	}
 	return resp.Symlink, err
 }
 
-// LinkAt makes the LinkAt RPC.
-func (f *ClientFD) LinkAt(ctx context.Context, targetFD FDID, name string) (Inode, error) {
+// LinkAt makes the LinkAt RPC. target must be an FD on the same connection as
+// f.
+func (f *ClientFD) LinkAt(ctx context.Context, target ClientFD, name string) (Inode, error) {
+	if target.client != f.client {
+		return Inode{}, unix.EXDEV
+	}
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return Inode{}, err
+	}
+	targetFD, err := target.currentFD(ctx)
+	if err != nil {
+		return Inode{}, err
+	}
 	req := LinkAtReq{
-		DirFD:  f.fd,
+		DirFD:  fd,
 		Target: targetFD,
 		Name:   SizedString(name),
 	}
 
 	var resp LinkAtResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(LinkAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(LinkAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
+	if err == nil {
+		f.client.trackChild(fd, name, &resp.Link)
+	}
 	return resp.Link, err
 }
 
 // MknodAt makes the MknodAt RPC.
 func (f *ClientFD) MknodAt(ctx context.Context, name string, mode linux.FileMode, uid UID, gid GID, minor, major uint32) (Inode, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return Inode{}, err
+	}
 	var req MknodAtReq
-	req.DirFD = f.fd
+	req.DirFD = fd
 	req.Name = SizedString(name)
 	req.Mode = mode
 	req.UID = uid
@@ -276,15 +395,22 @@ func (f *ClientFD) MknodAt(ctx context.Context, name string, mode linux.FileMode
 
 	var resp MknodAtResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(MknodAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(MknodAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
+	if err == nil {
+		f.client.trackChild(fd, name, &resp.Child)
+	}
 	return resp.Child, err
 }
 
 // SetStat makes the SetStat RPC.
 func (f *ClientFD) SetStat(ctx context.Context, stat *linux.Statx) (uint32, error, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
 	req := SetStatReq{
-		FD:   f.fd,
+		FD:   fd,
 		Mask: stat.Mask,
 		Mode: uint32(stat.Mode),
 		UID:  UID(stat.UID),
@@ -302,36 +428,47 @@ func (f *ClientFD) SetStat(ctx context.Context, stat *linux.Statx) (uint32, erro
 
 	var resp SetStatResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(SetStat, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(SetStat, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return resp.FailureMask, unix.Errno(resp.FailureErrNo), err
 }
 
 // WalkMultiple makes the Walk RPC with multiple path components.
 func (f *ClientFD) WalkMultiple(ctx context.Context, names []string) (WalkStatus, []Inode, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return WalkSuccess, nil, err
+	}
 	req := WalkReq{
-		DirFD: f.fd,
+		DirFD: fd,
 		Path:  StringArray(names),
 	}
 
 	var resp WalkResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(Walk, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(Walk, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
+	if err == nil {
+		f.client.trackWalk(fd, names, resp.Inodes)
+	}
 	return resp.Status, resp.Inodes, err
 }
 
 // Walk makes the Walk RPC with just one path component to walk.
 func (f *ClientFD) Walk(ctx context.Context, name string) (Inode, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return Inode{}, err
+	}
 	req := WalkReq{
-		DirFD: f.fd,
+		DirFD: fd,
 		Path:  []string{name},
 	}
 
 	var inode [1]Inode
 	resp := WalkResp{Inodes: inode[:]}
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(Walk, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(Walk, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	if err != nil {
 		return Inode{}, err
@@ -355,86 +492,173 @@ func (f *ClientFD) Walk(ctx context.Context, name string) (Inode, error) {
 		log.Warningf("walk has success status but no results returned")
 		return Inode{}, unix.ENOENT
 	}
+	f.client.trackChild(fd, name, &inode[0])
 	return inode[0], err
 }
 
 // WalkStat makes the WalkStat RPC with multiple path components to walk.
 func (f *ClientFD) WalkStat(ctx context.Context, names []string) ([]linux.Statx, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return nil, err
+	}
 	req := WalkReq{
-		DirFD: f.fd,
+		DirFD: fd,
 		Path:  StringArray(names),
 	}
 
 	var resp WalkStatResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(WalkStat, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(WalkStat, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return resp.Stats, err
 }
 
 // StatFSTo makes the FStatFS RPC and populates statFS with the result.
 func (f *ClientFD) StatFSTo(ctx context.Context, statFS *StatFS) error {
-	req := FStatFSReq{FD: f.fd}
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return err
+	}
+	req := FStatFSReq{FD: fd}
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(FStatFS, uint32(req.SizeBytes()), req.MarshalUnsafe, statFS.CheckedUnmarshal, nil, req.String, statFS.String)
+	err = f.client.SndRcvMessage(FStatFS, uint32(req.SizeBytes()), req.MarshalUnsafe, statFS.CheckedUnmarshal, nil, req.String, statFS.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return err
 }
 
 // Allocate makes the FAllocate RPC.
 func (f *ClientFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return err
+	}
 	req := FAllocateReq{
-		FD:     f.fd,
+		FD:     fd,
 		Mode:   mode,
 		Offset: offset,
 		Length: length,
 	}
 	var resp FAllocateResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(FAllocate, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(FAllocate, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return err
 }
 
+// CopyFileRange makes the CopyFileRange RPC, copying up to count bytes from
+// src at offset srcOff to f at offset off. src must be an FD on the same
+// connection as f.
+func (f *ClientFD) CopyFileRange(ctx context.Context, src ClientFD, srcOff, off, count uint64) (uint64, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if src.client != f.client {
+		return 0, unix.EXDEV
+	}
+	srcFD, err := src.currentFD(ctx)
+	if err != nil {
+		return 0, err
+	}
+	req := CopyFileRangeReq{
+		SrcFD:     srcFD,
+		DstFD:     fd,
+		SrcOffset: srcOff,
+		DstOffset: off,
+		Count:     count,
+	}
+	var resp CopyFileRangeResp
+	ctx.UninterruptibleSleepStart(false)
+	err = f.client.SndRcvMessage(CopyFileRange, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return resp.Count, err
+}
+
 // ReadLinkAt makes the ReadLinkAt RPC.
 func (f *ClientFD) ReadLinkAt(ctx context.Context) (string, error) {
-	req := ReadLinkAtReq{FD: f.fd}
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return "", err
+	}
+	req := ReadLinkAtReq{FD: fd}
 	var resp ReadLinkAtResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(ReadLinkAt, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(ReadLinkAt, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return string(resp.Target), err
 }
 
+// DonatePathFD makes the DonatePathFD RPC and returns the host FD donated by
+// the server. The caller owns the returned FD.
+func (f *ClientFD) DonatePathFD(ctx context.Context) (int, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return -1, err
+	}
+	req := DonatePathFDReq{FD: fd}
+	var resp DonatePathFDResp
+	var pathFD [1]int
+	ctx.UninterruptibleSleepStart(false)
+	err = f.client.SndRcvMessage(DonatePathFD, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, pathFD[:], req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	if err == nil && pathFD[0] < 0 {
+		err = unix.EBADF
+	}
+	return pathFD[0], err
+}
+
+// NameToHandle makes the NameToHandle RPC.
+func (f *ClientFD) NameToHandle(ctx context.Context) (NameToHandleResp, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return NameToHandleResp{}, err
+	}
+	req := NameToHandleReq{FD: fd}
+	var resp NameToHandleResp
+	ctx.UninterruptibleSleepStart(false)
+	err = f.client.SndRcvMessage(NameToHandle, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return resp, err
+}
+
 // Flush makes the Flush RPC.
 func (f *ClientFD) Flush(ctx context.Context) error {
 	if !f.client.IsSupported(Flush) {
 		// If Flush is not supported, it probably means that it would be a noop.
 		return nil
 	}
-	req := FlushReq{FD: f.fd}
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return err
+	}
+	req := FlushReq{FD: fd}
 	var resp FlushResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(Flush, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(Flush, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return err
 }
 
 // BindAt makes the BindAt RPC.
 func (f *ClientFD) BindAt(ctx context.Context, sockType linux.SockType, name string, mode linux.FileMode, uid UID, gid GID) (Inode, *ClientBoundSocketFD, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return Inode{}, nil, err
+	}
 	var (
 		req          BindAtReq
 		resp         BindAtResp
 		hostSocketFD [1]int
 	)
-	req.DirFD = f.fd
+	req.DirFD = fd
 	req.SockType = primitive.Uint32(sockType)
 	req.Name = SizedString(name)
 	req.Mode = mode
 	req.UID = uid
 	req.GID = gid
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(BindAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, hostSocketFD[:], req.String, resp.String)
+	err = f.client.SndRcvMessage(BindAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, hostSocketFD[:], req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	if err == nil && hostSocketFD[0] < 0 {
 		// No host socket fd? We can't proceed.
@@ -455,6 +679,7 @@ func (f *ClientFD) BindAt(ctx context.Context, sockType linux.SockType, name str
 		fd:             resp.BoundSocketFD,
 		notificationFD: int32(hostSocketFD[0]),
 		client:         f.client,
+		gen:            f.client.currentGeneration(),
 	}
 
 	return resp.Child, cbsFD, err
@@ -462,11 +687,15 @@ func (f *ClientFD) BindAt(ctx context.Context, sockType linux.SockType, name str
 
 // Connect makes the Connect RPC.
 func (f *ClientFD) Connect(ctx context.Context, sockType linux.SockType) (int, error) {
-	req := ConnectReq{FD: f.fd, SockType: uint32(sockType)}
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return -1, err
+	}
+	req := ConnectReq{FD: fd, SockType: uint32(sockType)}
 	var resp ConnectResp
 	var sockFD [1]int
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(Connect, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, sockFD[:], req.String, resp.String)
+	err = f.client.SndRcvMessage(Connect, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, sockFD[:], req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	if err == nil && sockFD[0] < 0 {
 		err = unix.EBADF
@@ -476,101 +705,140 @@ func (f *ClientFD) Connect(ctx context.Context, sockType linux.SockType) (int, e
 
 // UnlinkAt makes the UnlinkAt RPC.
 func (f *ClientFD) UnlinkAt(ctx context.Context, name string, flags uint32) error {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return err
+	}
 	req := UnlinkAtReq{
-		DirFD: f.fd,
+		DirFD: fd,
 		Name:  SizedString(name),
 		Flags: primitive.Uint32(flags),
 	}
 	var resp UnlinkAtResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(UnlinkAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(UnlinkAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return err
 }
 
 // RenameAt makes the RenameAt RPC which renames oldName inside directory f to
-// newDirFD directory with name newName.
-func (f *ClientFD) RenameAt(ctx context.Context, oldName string, newDirFD FDID, newName string) error {
+// newDir directory with name newName. newDir must be an FD on the same
+// connection as f.
+func (f *ClientFD) RenameAt(ctx context.Context, oldName string, newDir ClientFD, newName string) error {
+	if newDir.client != f.client {
+		return unix.EXDEV
+	}
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return err
+	}
+	newDirFD, err := newDir.currentFD(ctx)
+	if err != nil {
+		return err
+	}
 	req := RenameAtReq{
-		OldDir:  f.fd,
+		OldDir:  fd,
 		OldName: SizedString(oldName),
 		NewDir:  newDirFD,
 		NewName: SizedString(newName),
 	}
 	var resp RenameAtResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(RenameAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(RenameAt, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
+	if err == nil {
+		f.client.trackRename(fd, oldName, newDirFD, newName)
+	}
 	return err
 }
 
 // Getdents64 makes the Getdents64 RPC.
 func (f *ClientFD) Getdents64(ctx context.Context, count int32) ([]Dirent64, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return nil, err
+	}
 	req := Getdents64Req{
-		DirFD: f.fd,
+		DirFD: fd,
 		Count: count,
 	}
 
 	var resp Getdents64Resp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(Getdents64, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(Getdents64, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return resp.Dirents, err
 }
 
 // ListXattr makes the FListXattr RPC.
 func (f *ClientFD) ListXattr(ctx context.Context, size uint64) ([]string, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return nil, err
+	}
 	req := FListXattrReq{
-		FD:   f.fd,
+		FD:   fd,
 		Size: size,
 	}
 
 	var resp FListXattrResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(FListXattr, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(FListXattr, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return resp.Xattrs, err
 }
 
 // GetXattr makes the FGetXattr RPC.
 func (f *ClientFD) GetXattr(ctx context.Context, name string, size uint64) (string, error) {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return "", err
+	}
 	req := FGetXattrReq{
-		FD:      f.fd,
+		FD:      fd,
 		Name:    SizedString(name),
 		BufSize: primitive.Uint32(size),
 	}
 
 	var resp FGetXattrResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(FGetXattr, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(FGetXattr, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return string(resp.Value), err
 }
 
 // SetXattr makes the FSetXattr RPC.
 func (f *ClientFD) SetXattr(ctx context.Context, name string, value string, flags uint32) error {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return err
+	}
 	req := FSetXattrReq{
-		FD:    f.fd,
+		FD:    fd,
 		Name:  SizedString(name),
 		Value: SizedString(value),
 		Flags: primitive.Uint32(flags),
 	}
 	var resp FSetXattrResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(FSetXattr, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(FSetXattr, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return err
 }
 
 // RemoveXattr makes the FRemoveXattr RPC.
 func (f *ClientFD) RemoveXattr(ctx context.Context, name string) error {
+	fd, err := f.currentFD(ctx)
+	if err != nil {
+		return err
+	}
 	req := FRemoveXattrReq{
-		FD:   f.fd,
+		FD:   fd,
 		Name: SizedString(name),
 	}
 	var resp FRemoveXattrResp
 	ctx.UninterruptibleSleepStart(false)
-	err := f.client.SndRcvMessage(FRemoveXattr, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	err = f.client.SndRcvMessage(FRemoveXattr, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String)
 	ctx.UninterruptibleSleepFinish(false)
 	return err
 }
@@ -588,6 +856,11 @@ type ClientBoundSocketFD struct {
 	notificationFD int32
 
 	client *Client
+
+	// gen is the Client.generation of the connection on which fd was
+	// obtained. Bound sockets don't survive a reconnect, since the server
+	// can't rebind them on behalf of their listeners.
+	gen uint64
 }
 
 // Close implements transport.BoundSocketFD.Close.
@@ -595,7 +868,9 @@ func (f *ClientBoundSocketFD) Close(ctx context.Context) {
 	_ = unix.Close(int(f.notificationFD))
 	// flush is true because the socket FD must be closed immediately on the
 	// server. close(2) on socket FD impacts application behavior.
-	f.client.CloseFD(ctx, f.fd, true /* flush */)
+	if fd, ok := f.client.forget(fdKey{gen: f.gen, fd: f.fd}); ok {
+		f.client.CloseFD(ctx, fd, true /* flush */)
+	}
 }
 
 // NotificationFD implements transport.BoundSocketFD.NotificationFD.
@@ -605,6 +880,9 @@ func (f *ClientBoundSocketFD) NotificationFD() int32 {
 
 // Listen implements transport.BoundSocketFD.Listen.
 func (f *ClientBoundSocketFD) Listen(ctx context.Context, backlog int32) error {
+	if err := f.client.checkGeneration(ctx, f.gen); err != nil {
+		return err
+	}
 	req := ListenReq{
 		FD:      f.fd,
 		Backlog: backlog,
@@ -618,6 +896,9 @@ func (f *ClientBoundSocketFD) Listen(ctx context.Context, backlog int32) error {
 
 // Accept implements transport.BoundSocketFD.Accept.
 func (f *ClientBoundSocketFD) Accept(ctx context.Context) (int, error) {
+	if err := f.client.checkGeneration(ctx, f.gen); err != nil {
+		return -1, err
+	}
 	req := AcceptReq{
 		FD: f.fd,
 	}
@@ -0,0 +1,82 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lisafs
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+)
+
+// rpcLatencyBucketer buckets RPC latencies exponentially from 1µs to about 4s.
+// The underflow bucket contains RPCs that took less than 1µs.
+var rpcLatencyBucketer = metric.NewExponentialBucketer(12, 0, float64(1000), 4)
+
+var (
+	// rpcLatency records the latency of the RPCs made by clients, including
+	// the time spent waiting for a communicator, by message type.
+	rpcLatency = metric.MustCreateNewTimerMetric("/gofer/rpc_latency", rpcLatencyBucketer, "Latency of lisafs RPCs made to gofers, in nanoseconds, by message type.", metric.NewField("message", midNames[:]))
+
+	// rpcsOutstanding is the number of RPCs that clients are waiting on.
+	rpcsOutstanding atomicbitops.Int64
+
+	// rpcLatencyKeys are the rpcLatency field keys of messages, indexed by
+	// MID.
+	rpcLatencyKeys [len(midNames)]int
+)
+
+func init() {
+	for m, name := range midNames {
+		rpcLatencyKeys[m] = rpcLatency.FieldKey(name)
+	}
+	metric.MustRegisterCustomUint64Metric("/gofer/rpcs_outstanding", false /* cumulative */, false /* sync */, "Number of lisafs RPCs to gofers that are in progress.", func(...string) uint64 {
+		return uint64(rpcsOutstanding.Load())
+	})
+}
+
+// slowRPCThreshold is the latency, in nanoseconds, above which RPCs are
+// logged. Slow RPCs aren't logged if it is 0.
+var slowRPCThreshold atomicbitops.Int64
+
+// slowRPCLogger logs slow RPCs. It is rate limited, since all RPCs are slow
+// when the host filesystem is.
+var slowRPCLogger = log.BasicRateLimitedLogger(time.Second)
+
+// SetSlowRPCThreshold makes clients log RPCs that take longer than threshold,
+// along with their requests. A threshold of 0 disables logging.
+func SetSlowRPCThreshold(threshold time.Duration) {
+	slowRPCThreshold.Store(threshold.Nanoseconds())
+}
+
+// rpcStart records the start of an RPC and returns its start time, to be
+// passed to rpcDone.
+func rpcStart() int64 {
+	rpcsOutstanding.Add(1)
+	return metric.CheapNowNano()
+}
+
+// rpcDone records the end of an RPC of type m that started at start.
+func rpcDone(m MID, start int64, reqString debugStringer) {
+	rpcsOutstanding.Add(-1)
+	ns := metric.CheapNowNano() - start
+	if int(m) < len(rpcLatencyKeys) {
+		rpcLatency.AddSampleByKey(ns, rpcLatencyKeys[m])
+	}
+	if threshold := slowRPCThreshold.Load(); threshold != 0 && ns > threshold {
+		slowRPCLogger.Warningf("lisafs: slow %s RPC took %v: %s", m, time.Duration(ns), reqString())
+	}
+}
@@ -81,6 +81,20 @@ type Connection struct {
 	fds map[FDID]genericFD
 	// nextFDID is the next available FDID. It is protected by fdsMu.
 	nextFDID FDID
+
+	delegationsMu sync.Mutex
+	// delegations is the set of control FDs that hold a delegation. It is
+	// protected by delegationsMu.
+	delegations map[FDID]struct{}
+	// recalled contains the FDs whose delegations have been recalled but not
+	// yet reported to the client. It is protected by delegationsMu.
+	recalled []FDID
+	// recallsStopped is set once the connection starts closing, after which
+	// WaitRecall requests fail. It is protected by delegationsMu.
+	recallsStopped bool
+	// recallNotify is signalled when recalled becomes non-empty or
+	// recallsStopped is set.
+	recallNotify chan struct{}
 }
 
 // CreateConnection initializes a new connection which will be mounted at
@@ -101,6 +115,8 @@ func (s *Server) CreateConnection(sock *unet.Socket, mountPath string, readonly
 		channels:       make([]*channel, 0, maxChannels()),
 		fds:            make(map[FDID]genericFD),
 		nextFDID:       InvalidFDID + 1,
+		delegations:    make(map[FDID]struct{}),
+		recallNotify:   make(chan struct{}, 1),
 	}
 
 	alloc, err := flipcall.NewPacketWindowAllocator()
@@ -217,6 +233,10 @@ func (c *Connection) handleMsg(comm Communicator, m MID, payloadLen uint32) (ret
 }
 
 func (c *Connection) close() {
+	// WaitRecall requests block until a delegation is recalled, so fail them
+	// before waiting for inflight requests.
+	c.stopRecalls()
+
 	// Wait for completion of all inflight requests. This is mostly so that if
 	// a request is stuck, the sandbox supervisor has the opportunity to kill
 	// us with SIGABRT to get a stack dump of the offending handler.
@@ -369,3 +389,77 @@ func (c *Connection) stopTrackingFD(id FDID) genericFD {
 	delete(c.fds, id)
 	return fd
 }
+
+// addDelegation records that the control FD identified by id holds a
+// delegation.
+func (c *Connection) addDelegation(id FDID) {
+	c.delegationsMu.Lock()
+	defer c.delegationsMu.Unlock()
+	c.delegations[id] = struct{}{}
+}
+
+// removeDelegation forgets the delegation held by the control FD identified
+// by id, if any, without reporting it to the client.
+func (c *Connection) removeDelegation(id FDID) {
+	c.delegationsMu.Lock()
+	defer c.delegationsMu.Unlock()
+	delete(c.delegations, id)
+}
+
+// recallDelegation ends the delegation held by the control FD identified by
+// id, if any, and queues it to be reported to the client.
+func (c *Connection) recallDelegation(id FDID) {
+	c.delegationsMu.Lock()
+	defer c.delegationsMu.Unlock()
+	if _, ok := c.delegations[id]; !ok {
+		return
+	}
+	delete(c.delegations, id)
+	c.recalled = append(c.recalled, id)
+	c.notifyRecallLocked()
+}
+
+// waitRecall blocks until delegations have been recalled, and returns up to
+// maxFDs of the FDs whose delegations were recalled.
+func (c *Connection) waitRecall(maxFDs int) ([]FDID, error) {
+	for {
+		c.delegationsMu.Lock()
+		if c.recallsStopped {
+			// Let other waiters observe this too.
+			c.notifyRecallLocked()
+			c.delegationsMu.Unlock()
+			return nil, unix.ECONNRESET
+		}
+		if n := len(c.recalled); n > 0 {
+			if n > maxFDs {
+				n = maxFDs
+			}
+			ids := make([]FDID, n)
+			copy(ids, c.recalled)
+			c.recalled = c.recalled[:copy(c.recalled, c.recalled[n:])]
+			if len(c.recalled) > 0 {
+				c.notifyRecallLocked()
+			}
+			c.delegationsMu.Unlock()
+			return ids, nil
+		}
+		c.delegationsMu.Unlock()
+		<-c.recallNotify
+	}
+}
+
+// stopRecalls makes all pending and future waitRecall calls fail.
+func (c *Connection) stopRecalls() {
+	c.delegationsMu.Lock()
+	defer c.delegationsMu.Unlock()
+	c.recallsStopped = true
+	c.notifyRecallLocked()
+}
+
+// Precondition: c.delegationsMu must be locked.
+func (c *Connection) notifyRecallLocked() {
+	select {
+	case c.recallNotify <- struct{}{}:
+	default:
+	}
+}
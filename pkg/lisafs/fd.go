@@ -109,6 +109,9 @@ func (fd *ControlFD) destroyLocked() {
 	// Update node's control FD list.
 	fd.node.removeFD(fd)
 
+	// The delegation, if any, ends with fd.
+	fd.conn.removeDelegation(fd.id)
+
 	// Drop ref on node.
 	fd.node.DecRef(nil)
 
@@ -139,6 +142,12 @@ func (fd *ControlFD) Conn() *Connection {
 	return fd.conn
 }
 
+// RecallDelegation recalls the delegation held on fd, if any. Delegator
+// implementations call it when the delegated directory changes.
+func (fd *ControlFD) RecallDelegation() {
+	fd.conn.recallDelegation(fd.id)
+}
+
 // FileType returns the file mode only containing the file type bits.
 func (fd *ControlFD) FileType() linux.FileMode {
 	return fd.ftype
@@ -433,6 +442,19 @@ type ControlFDImpl interface {
 	// On the server, OpenCreate has a write concurrency guarantee.
 	OpenCreate(mode linux.FileMode, uid UID, gid GID, name string, flags uint32) (*ControlFD, linux.Statx, *OpenFD, int, error)
 
+	// OpenTmpfile creates an unnamed regular file inside the directory
+	// represented by this FD and opens it with the specified flags, like
+	// open(2) with O_TMPFILE. The created file has perms as specified by mode
+	// and owners as specified by uid and gid. Unless flags contains O_EXCL, the
+	// file can be given a name by calling Link on the returned ControlFD.
+	//
+	// OpenTmpfile may also optionally return a host FD for the opened file
+	// whose lifecycle is independent of the OpenFD. Returns -1 if not
+	// available.
+	//
+	// On the server, OpenTmpfile has a write concurrency guarantee.
+	OpenTmpfile(mode linux.FileMode, uid UID, gid GID, flags uint32) (*ControlFD, linux.Statx, *OpenFD, int, error)
+
 	// Mkdir creates a directory inside the directory represented by this FD. The
 	// created directory has perms as specified by mode and owners as specified
 	// by uid and gid.
@@ -551,6 +573,43 @@ type ControlFDImpl interface {
 	RemoveXattr(name string) error
 }
 
+// PathFDDonator is an optional interface that a ControlFDImpl may implement to
+// support the DonatePathFD RPC.
+type PathFDDonator interface {
+	// PathFD returns a new host FD for the file backing this control FD, which
+	// is opened either read-only or with O_PATH. Ownership of the returned FD
+	// is transferred to the caller.
+	//
+	// On the server, PathFD has a read concurrency guarantee.
+	PathFD() (int, error)
+}
+
+// Delegator is an optional interface that a ControlFDImpl may implement to
+// support the Delegate RPC.
+type Delegator interface {
+	// Delegate starts watching the directory backing this control FD for
+	// changes. Until this FD is closed, the implementation must call
+	// ControlFD.RecallDelegation whenever it observes a change to the
+	// directory's attributes, its entries, or the attributes or contents of
+	// the files it contains. Delegate is only called on directories, and may
+	// be called again after a delegation has been recalled.
+	//
+	// On the server, Delegate has a read concurrency guarantee.
+	Delegate() error
+}
+
+// HandleEncoder is an optional interface that a ControlFDImpl may implement to
+// support the NameToHandle RPC.
+type HandleEncoder interface {
+	// NameToHandle returns the stat(2) results for the file backing this
+	// control FD, which must include its device and inode numbers, along with
+	// its host file handle as returned by name_to_handle_at(2). If the host
+	// filesystem does not support file handles, handle is empty.
+	//
+	// On the server, NameToHandle has a read concurrency guarantee.
+	NameToHandle() (stat linux.Statx, handleType int32, handle []byte, err error)
+}
+
 // OpenFDImpl contains implementation details for a OpenFD. Implementations of
 // OpenFDImpl should contain their associated OpenFD by value as their first
 // field.
@@ -599,6 +658,14 @@ type OpenFDImpl interface {
 	// On the server, Allocate has a write concurrency guarantee.
 	Allocate(mode, off, length uint64) error
 
+	// CopyFileRange copies up to count bytes from src at offset srcOff to this
+	// FD at offset off, as for copy_file_range(2), and returns the number of
+	// bytes copied. src is an FD opened on the same connection.
+	//
+	// On the server, CopyFileRange has a write concurrency guarantee on this
+	// FD, and no concurrency guarantee on src.
+	CopyFileRange(src OpenFDImpl, srcOff, off, count uint64) (uint64, error)
+
 	// Flush can be used to clean up the file state. Behavior is
 	// implementation-specific.
 	//
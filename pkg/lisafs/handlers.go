@@ -46,38 +46,44 @@ const (
 type RPCHandler func(c *Connection, comm Communicator, payloadLen uint32) (uint32, error)
 
 var handlers = [...]RPCHandler{
-	Error:        ErrorHandler,
-	Mount:        MountHandler,
-	Channel:      ChannelHandler,
-	FStat:        FStatHandler,
-	SetStat:      SetStatHandler,
-	Walk:         WalkHandler,
-	WalkStat:     WalkStatHandler,
-	OpenAt:       OpenAtHandler,
-	OpenCreateAt: OpenCreateAtHandler,
-	Close:        CloseHandler,
-	FSync:        FSyncHandler,
-	PWrite:       PWriteHandler,
-	PRead:        PReadHandler,
-	MkdirAt:      MkdirAtHandler,
-	MknodAt:      MknodAtHandler,
-	SymlinkAt:    SymlinkAtHandler,
-	LinkAt:       LinkAtHandler,
-	FStatFS:      FStatFSHandler,
-	FAllocate:    FAllocateHandler,
-	ReadLinkAt:   ReadLinkAtHandler,
-	Flush:        FlushHandler,
-	UnlinkAt:     UnlinkAtHandler,
-	RenameAt:     RenameAtHandler,
-	Getdents64:   Getdents64Handler,
-	FGetXattr:    FGetXattrHandler,
-	FSetXattr:    FSetXattrHandler,
-	FListXattr:   FListXattrHandler,
-	FRemoveXattr: FRemoveXattrHandler,
-	Connect:      ConnectHandler,
-	BindAt:       BindAtHandler,
-	Listen:       ListenHandler,
-	Accept:       AcceptHandler,
+	Error:         ErrorHandler,
+	Mount:         MountHandler,
+	Channel:       ChannelHandler,
+	FStat:         FStatHandler,
+	SetStat:       SetStatHandler,
+	Walk:          WalkHandler,
+	WalkStat:      WalkStatHandler,
+	OpenAt:        OpenAtHandler,
+	OpenCreateAt:  OpenCreateAtHandler,
+	Close:         CloseHandler,
+	FSync:         FSyncHandler,
+	PWrite:        PWriteHandler,
+	PRead:         PReadHandler,
+	MkdirAt:       MkdirAtHandler,
+	MknodAt:       MknodAtHandler,
+	SymlinkAt:     SymlinkAtHandler,
+	LinkAt:        LinkAtHandler,
+	FStatFS:       FStatFSHandler,
+	FAllocate:     FAllocateHandler,
+	ReadLinkAt:    ReadLinkAtHandler,
+	Flush:         FlushHandler,
+	UnlinkAt:      UnlinkAtHandler,
+	RenameAt:      RenameAtHandler,
+	Getdents64:    Getdents64Handler,
+	FGetXattr:     FGetXattrHandler,
+	FSetXattr:     FSetXattrHandler,
+	FListXattr:    FListXattrHandler,
+	FRemoveXattr:  FRemoveXattrHandler,
+	Connect:       ConnectHandler,
+	BindAt:        BindAtHandler,
+	Listen:        ListenHandler,
+	Accept:        AcceptHandler,
+	DonatePathFD:  DonatePathFDHandler,
+	Delegate:      DelegateHandler,
+	WaitRecall:    WaitRecallHandler,
+	CopyFileRange: CopyFileRangeHandler,
+	OpenTmpfileAt: OpenTmpfileAtHandler,
+	NameToHandle:  NameToHandleHandler,
 }
 
 // ErrorHandler handles Error message.
@@ -607,6 +613,65 @@ func OpenCreateAtHandler(c *Connection, comm Communicator, payloadLen uint32) (u
 	return respLen, nil
 }
 
+// OpenTmpfileAtHandler handles the OpenTmpfileAt RPC.
+func OpenTmpfileAtHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	if c.readonly {
+		return 0, unix.EROFS
+	}
+	var req OpenTmpfileAtReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	// Only keep allowed open flags. O_EXCL is meaningful here: it prevents the
+	// file from ever being linked into the filesystem.
+	if allowedFlags := req.Flags & (allowedOpenFlags | unix.O_EXCL); allowedFlags != req.Flags {
+		log.Debugf("discarding open flags that are not allowed: old open flags = %d, new open flags = %d", req.Flags, allowedFlags)
+		req.Flags = allowedFlags
+	}
+
+	fd, err := c.lookupControlFD(req.DirFD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+	if !fd.IsDir() {
+		return 0, unix.ENOTDIR
+	}
+
+	var (
+		childFD    *ControlFD
+		childStat  linux.Statx
+		openFD     *OpenFD
+		hostOpenFD int
+	)
+	if err := fd.safelyWrite(func() error {
+		if fd.node.isDeleted() {
+			return unix.ENOENT
+		}
+		childFD, childStat, openFD, hostOpenFD, err = fd.impl.OpenTmpfile(req.Mode, req.UID, req.GID, req.Flags)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	if hostOpenFD >= 0 {
+		if err := comm.DonateFD(hostOpenFD); err != nil {
+			return 0, err
+		}
+	}
+	resp := OpenTmpfileAtResp{
+		NewFD: openFD.id,
+		Child: Inode{
+			ControlFD: childFD.id,
+			Stat:      childStat,
+		},
+	}
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalUnsafe(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
 // CloseHandler handles the Close RPC.
 func CloseHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
 	var req CloseReq
@@ -984,6 +1049,47 @@ func FAllocateHandler(c *Connection, comm Communicator, payloadLen uint32) (uint
 	})
 }
 
+// CopyFileRangeHandler handles the CopyFileRange RPC.
+func CopyFileRangeHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	if c.readonly {
+		return 0, unix.EROFS
+	}
+	var req CopyFileRangeReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	srcFD, err := c.lookupOpenFD(req.SrcFD)
+	if err != nil {
+		return 0, err
+	}
+	defer srcFD.DecRef(nil)
+	if !srcFD.readable {
+		return 0, unix.EBADF
+	}
+	dstFD, err := c.lookupOpenFD(req.DstFD)
+	if err != nil {
+		return 0, err
+	}
+	defer dstFD.DecRef(nil)
+	if !dstFD.writable {
+		return 0, unix.EBADF
+	}
+
+	// Only the destination is locked: locking both nodes could deadlock
+	// with a concurrent copy in the other direction.
+	var resp CopyFileRangeResp
+	if err := dstFD.controlFD.safelyWrite(func() error {
+		resp.Count, err = dstFD.impl.CopyFileRange(srcFD.impl, req.SrcOffset, req.DstOffset, req.Count)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalUnsafe(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
 // ReadLinkAtHandler handles the ReadLinkAt RPC.
 func ReadLinkAtHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
 	var req ReadLinkAtReq
@@ -1181,6 +1287,162 @@ func AcceptHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32,
 	return respLen, nil
 }
 
+// DonatePathFDHandler handles the DonatePathFD RPC.
+func DonatePathFDHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	// Host FDs donated to the client can be used to reach the backing files
+	// without going through the server, so only hand them out when the server
+	// would refuse all modifications anyway.
+	if !c.readonly {
+		return 0, unix.EPERM
+	}
+	var req DonatePathFDReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	fd, err := c.lookupControlFD(req.FD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+	donator, ok := fd.impl.(PathFDDonator)
+	if !ok {
+		return 0, unix.EOPNOTSUPP
+	}
+	var pathFD int
+	if err := fd.safelyRead(func() error {
+		if fd.node.isDeleted() {
+			return unix.EINVAL
+		}
+		var err error
+		pathFD, err = donator.PathFD()
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	if err := comm.DonateFD(pathFD); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// NameToHandleHandler handles the NameToHandle RPC.
+func NameToHandleHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req NameToHandleReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	fd, err := c.lookupControlFD(req.FD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+	encoder, ok := fd.impl.(HandleEncoder)
+	if !ok {
+		return 0, unix.EOPNOTSUPP
+	}
+	var resp NameToHandleResp
+	if err := fd.safelyRead(func() error {
+		if fd.node.isDeleted() {
+			return unix.ESTALE
+		}
+		stat, handleType, handle, err := encoder.NameToHandle()
+		if err != nil {
+			return err
+		}
+		if len(handle) > len(resp.Handle) {
+			return unix.EOVERFLOW
+		}
+		resp.DevMajor = stat.DevMajor
+		resp.DevMinor = stat.DevMinor
+		resp.Ino = stat.Ino
+		resp.HandleType = handleType
+		resp.HandleBytes = uint32(copy(resp.Handle[:], handle))
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalUnsafe(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
+// DelegateHandler handles the Delegate RPC.
+func DelegateHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req DelegateReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	// Delegations are best effort. FDs on which a delegation can't be granted
+	// are left out of the response, and the client keeps revalidating them.
+	var resp DelegateResp
+	for _, id := range req.FDs {
+		if c.delegate(id) {
+			resp.FDs = append(resp.FDs, id)
+		}
+	}
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalBytes(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
+// delegate grants a delegation on the control FD identified by id. It returns
+// true if the delegation was granted.
+func (c *Connection) delegate(id FDID) bool {
+	fd, err := c.lookupControlFD(id)
+	if err != nil {
+		return false
+	}
+	defer fd.DecRef(nil)
+	delegator, ok := fd.impl.(Delegator)
+	if !ok || !fd.IsDir() {
+		return false
+	}
+	// Record the delegation before the implementation starts watching, so
+	// that no change it observes can go unrecalled.
+	c.addDelegation(id)
+	if err := fd.safelyRead(func() error {
+		if fd.node.isDeleted() {
+			return unix.EINVAL
+		}
+		return delegator.Delegate()
+	}); err != nil {
+		c.removeDelegation(id)
+		return false
+	}
+	return true
+}
+
+// WaitRecallHandler handles the WaitRecall RPC.
+func WaitRecallHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	// WaitRecall blocks until a delegation is recalled. The main socket is
+	// served by a single goroutine, which must not be stalled.
+	if _, ok := comm.(*sockCommunicator); ok {
+		return 0, unix.EINVAL
+	}
+	var req WaitRecallReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	// Report as many recalls as fit in the response; the rest are reported in
+	// response to the next request.
+	maxFDs := (int(c.maxMessageSize) - (*primitive.Uint16)(nil).SizeBytes()) / (*FDID)(nil).SizeBytes()
+	if maxFDs > math.MaxUint16 {
+		maxFDs = math.MaxUint16
+	}
+	ids, err := c.waitRecall(maxFDs)
+	if err != nil {
+		return 0, err
+	}
+	resp := WaitRecallResp{FDs: ids}
+	respLen := uint32(resp.SizeBytes())
+	resp.MarshalBytes(comm.PayloadBuf(respLen))
+	return respLen, nil
+}
+
 // UnlinkAtHandler handles the UnlinkAt RPC.
 func UnlinkAtHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
 	if c.readonly {
@@ -172,8 +172,88 @@ const (
 
 	// Accept is analogous to accept4(2).
 	Accept MID = 31
+
+	// DonatePathFD requests a host FD for the file backing a control FD, which
+	// the client can use to make path-based syscalls directly. It is only
+	// supported on read-only connections.
+	DonatePathFD MID = 32
+
+	// Delegate requests delegations on directory control FDs. While a
+	// delegation is held, the server recalls it as soon as the directory, its
+	// entries or the files it contains change, so the client may serve
+	// lookups, stats and directory reads beneath it from its cache.
+	Delegate MID = 33
+
+	// WaitRecall blocks until the server recalls one or more delegations. The
+	// protocol only has client-initiated RPCs, so the server delivers recalls
+	// as the response to an outstanding WaitRecall request.
+	WaitRecall MID = 34
+
+	// CopyFileRange is analogous to copy_file_range(2) between two FDs opened
+	// on the same connection.
+	CopyFileRange MID = 35
+
+	// OpenTmpfileAt is analogous to openat(2) with O_TMPFILE. It creates an
+	// unnamed regular file in a directory and opens it. The file can later be
+	// given a name with LinkAt.
+	OpenTmpfileAt MID = 36
+
+	// NameToHandle is analogous to name_to_handle_at(2) with AT_EMPTY_PATH on
+	// a control FD. It returns the host device and inode numbers of the file
+	// and, if the host filesystem supports it, its host file handle.
+	NameToHandle MID = 37
 )
 
+// midNames are the names of messages, indexed by MID.
+var midNames = [...]string{
+	Error:         "Error",
+	Mount:         "Mount",
+	Channel:       "Channel",
+	FStat:         "FStat",
+	SetStat:       "SetStat",
+	Walk:          "Walk",
+	WalkStat:      "WalkStat",
+	OpenAt:        "OpenAt",
+	OpenCreateAt:  "OpenCreateAt",
+	Close:         "Close",
+	FSync:         "FSync",
+	PWrite:        "PWrite",
+	PRead:         "PRead",
+	MkdirAt:       "MkdirAt",
+	MknodAt:       "MknodAt",
+	SymlinkAt:     "SymlinkAt",
+	LinkAt:        "LinkAt",
+	FStatFS:       "FStatFS",
+	FAllocate:     "FAllocate",
+	ReadLinkAt:    "ReadLinkAt",
+	Flush:         "Flush",
+	Connect:       "Connect",
+	UnlinkAt:      "UnlinkAt",
+	RenameAt:      "RenameAt",
+	Getdents64:    "Getdents64",
+	FGetXattr:     "FGetXattr",
+	FSetXattr:     "FSetXattr",
+	FListXattr:    "FListXattr",
+	FRemoveXattr:  "FRemoveXattr",
+	BindAt:        "BindAt",
+	Listen:        "Listen",
+	Accept:        "Accept",
+	DonatePathFD:  "DonatePathFD",
+	Delegate:      "Delegate",
+	WaitRecall:    "WaitRecall",
+	CopyFileRange: "CopyFileRange",
+	OpenTmpfileAt: "OpenTmpfileAt",
+	NameToHandle:  "NameToHandle",
+}
+
+// String implements fmt.Stringer.String.
+func (m MID) String() string {
+	if int(m) < len(midNames) && midNames[m] != "" {
+		return midNames[m]
+	}
+	return fmt.Sprintf("MID(%d)", uint16(m))
+}
+
 const (
 	// NoUID is a sentinel used to indicate no valid UID.
 	NoUID UID = math.MaxUint32
@@ -719,6 +799,36 @@ func (o *OpenCreateAtResp) String() string {
 	return fmt.Sprintf("OpenCreateAtResp{Child: %+v, NewFD: %d}", o.Child, o.NewFD)
 }
 
+// OpenTmpfileAtReq is used to make OpenTmpfileAt requests.
+//
+// +marshal boundCheck
+type OpenTmpfileAtReq struct {
+	DirFD FDID
+	UID   UID
+	GID   GID
+	Mode  linux.FileMode
+	_     uint16 // Need to make struct packed.
+	Flags uint32
+}
+
+// String implements fmt.Stringer.String.
+func (o *OpenTmpfileAtReq) String() string {
+	return fmt.Sprintf("OpenTmpfileAtReq{DirFD: %d, Mode: %s, UID: %d, GID: %d, Flags: %d}", o.DirFD, o.Mode, o.UID, o.GID, o.Flags)
+}
+
+// OpenTmpfileAtResp is used to communicate successful OpenTmpfileAt results.
+//
+// +marshal boundCheck
+type OpenTmpfileAtResp struct {
+	Child Inode
+	NewFD FDID
+}
+
+// String implements fmt.Stringer.String.
+func (o *OpenTmpfileAtResp) String() string {
+	return fmt.Sprintf("OpenTmpfileAtResp{Child: %+v, NewFD: %d}", o.Child, o.NewFD)
+}
+
 // FdArray is a utility struct which implements a marshallable type for
 // communicating an array of FDIDs. In memory, the array data is preceded by a
 // uint16 denoting the array length.
@@ -1206,6 +1316,34 @@ func (*FAllocateResp) String() string {
 	return "FAllocateResp{}"
 }
 
+// CopyFileRangeReq is used to copy_file_range(2) from SrcFD to DstFD.
+//
+// +marshal boundCheck
+type CopyFileRangeReq struct {
+	SrcFD     FDID
+	DstFD     FDID
+	SrcOffset uint64
+	DstOffset uint64
+	Count     uint64
+}
+
+// String implements fmt.Stringer.String.
+func (c *CopyFileRangeReq) String() string {
+	return fmt.Sprintf("CopyFileRangeReq{SrcFD: %d, DstFD: %d, SrcOffset: %d, DstOffset: %d, Count: %d}", c.SrcFD, c.DstFD, c.SrcOffset, c.DstOffset, c.Count)
+}
+
+// CopyFileRangeResp is used to return the number of bytes copied.
+//
+// +marshal boundCheck
+type CopyFileRangeResp struct {
+	Count uint64
+}
+
+// String implements fmt.Stringer.String.
+func (c *CopyFileRangeResp) String() string {
+	return fmt.Sprintf("CopyFileRangeResp{Count: %d}", c.Count)
+}
+
 // ReadLinkAtReq is used to readlinkat(2) at the specified FD.
 //
 // +marshal boundCheck
@@ -1813,3 +1951,141 @@ func (l *FListXattrResp) MarshalBytes(dst []byte) []byte {
 func (l *FListXattrResp) CheckedUnmarshal(src []byte) ([]byte, bool) {
 	return l.Xattrs.CheckedUnmarshal(src)
 }
+
+// DonatePathFDReq is used to request a host FD for the specified FD.
+//
+// +marshal boundCheck
+type DonatePathFDReq struct {
+	FD FDID
+}
+
+// String implements fmt.Stringer.String.
+func (d *DonatePathFDReq) String() string {
+	return fmt.Sprintf("DonatePathFDReq{FD: %d}", d.FD)
+}
+
+// DonatePathFDResp is an empty response to DonatePathFDReq. The host FD is
+// donated alongside it.
+type DonatePathFDResp struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*DonatePathFDResp) String() string {
+	return "DonatePathFDResp{}"
+}
+
+// DelegateReq is used to request delegations on the specified directory
+// control FDs.
+type DelegateReq struct {
+	FDs FdArray
+}
+
+// String implements fmt.Stringer.String.
+func (d *DelegateReq) String() string {
+	return fmt.Sprintf("DelegateReq{FDs: %s}", d.FDs.String())
+}
+
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (d *DelegateReq) SizeBytes() int {
+	return d.FDs.SizeBytes()
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (d *DelegateReq) MarshalBytes(dst []byte) []byte {
+	return d.FDs.MarshalBytes(dst)
+}
+
+// CheckedUnmarshal implements marshal.CheckedMarshallable.CheckedUnmarshal.
+func (d *DelegateReq) CheckedUnmarshal(src []byte) ([]byte, bool) {
+	return d.FDs.CheckedUnmarshal(src)
+}
+
+// DelegateResp contains the FDs from DelegateReq on which delegations were
+// granted.
+type DelegateResp struct {
+	FDs FdArray
+}
+
+// String implements fmt.Stringer.String.
+func (d *DelegateResp) String() string {
+	return fmt.Sprintf("DelegateResp{FDs: %s}", d.FDs.String())
+}
+
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (d *DelegateResp) SizeBytes() int {
+	return d.FDs.SizeBytes()
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (d *DelegateResp) MarshalBytes(dst []byte) []byte {
+	return d.FDs.MarshalBytes(dst)
+}
+
+// CheckedUnmarshal implements marshal.CheckedMarshallable.CheckedUnmarshal.
+func (d *DelegateResp) CheckedUnmarshal(src []byte) ([]byte, bool) {
+	return d.FDs.CheckedUnmarshal(src)
+}
+
+// WaitRecallReq is an empty request to wait for delegation recalls.
+type WaitRecallReq struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*WaitRecallReq) String() string {
+	return "WaitRecallReq{}"
+}
+
+// WaitRecallResp contains the FDs whose delegations have been recalled.
+type WaitRecallResp struct {
+	FDs FdArray
+}
+
+// String implements fmt.Stringer.String.
+func (w *WaitRecallResp) String() string {
+	return fmt.Sprintf("WaitRecallResp{FDs: %s}", w.FDs.String())
+}
+
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (w *WaitRecallResp) SizeBytes() int {
+	return w.FDs.SizeBytes()
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (w *WaitRecallResp) MarshalBytes(dst []byte) []byte {
+	return w.FDs.MarshalBytes(dst)
+}
+
+// CheckedUnmarshal implements marshal.CheckedMarshallable.CheckedUnmarshal.
+func (w *WaitRecallResp) CheckedUnmarshal(src []byte) ([]byte, bool) {
+	return w.FDs.CheckedUnmarshal(src)
+}
+
+// NameToHandleReq is used to request a stable identifier for the file
+// represented by FD.
+//
+// +marshal boundCheck
+type NameToHandleReq struct {
+	FD FDID
+}
+
+// String implements fmt.Stringer.String.
+func (n *NameToHandleReq) String() string {
+	return fmt.Sprintf("NameToHandleReq{FD: %d}", n.FD)
+}
+
+// NameToHandleResp contains the host device and inode numbers of a file. If
+// HandleBytes is non-zero, the first HandleBytes bytes of Handle are the
+// file's host file handle, of type HandleType.
+//
+// +marshal boundCheck
+type NameToHandleResp struct {
+	DevMajor    uint32
+	DevMinor    uint32
+	Ino         uint64
+	HandleType  int32
+	HandleBytes uint32
+	Handle      [128]byte // MAX_HANDLE_SZ
+}
+
+// String implements fmt.Stringer.String.
+func (n *NameToHandleResp) String() string {
+	return fmt.Sprintf("NameToHandleResp{DevMajor: %d, DevMinor: %d, Ino: %d, HandleType: %d, HandleBytes: %d}", n.DevMajor, n.DevMinor, n.Ino, n.HandleType, n.HandleBytes)
+}
@@ -115,7 +115,9 @@ func (n *Node) DecRef(context.Context) {
 	n.parent.childrenMu.Lock()
 	deleted := false
 	n.nodeRefs.DecRef(func() {
-		n.parent.removeChildLocked(n.name)
+		if n.name != "" {
+			n.parent.removeChildLocked(n.name)
+		}
 		deleted = true
 	})
 	n.parent.childrenMu.Unlock()
@@ -140,6 +142,18 @@ func (n *Node) InitLocked(name string, parent *Node) {
 	}
 }
 
+// InitUnnamed must be called before first use of a node that represents an
+// unnamed file in parent, such as one created with O_TMPFILE. Such a node
+// holds a ref on parent but is not one of its children, so it can not be
+// found by LookupChildLocked.
+//
+// Postconditions: A ref on n is transferred to the caller.
+func (n *Node) InitUnnamed(parent *Node) {
+	n.nodeRefs.InitRefs()
+	n.parent = parent
+	parent.IncRef()
+}
+
 // LookupChildLocked looks up for a child with given name. Returns nil if child
 // does not exist.
 //
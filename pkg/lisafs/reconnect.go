@@ -0,0 +1,587 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lisafs
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/unet"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// Reconnection
+//
+// A client with reconnection enabled survives the loss of its connection to
+// the server, e.g. because the server process crashed. RPCs made while the
+// connection is lost wait for a new connection to be established with
+// Reconnect, for up to the reconnect timeout. The new server is expected to
+// serve the same tree as the old one.
+//
+// FDIDs are specific to a connection, so the client remembers how each FD
+// was obtained: the path of the file relative to the mount root, its identity
+// (device and inode number) and, for open FDs, the open flags. After a
+// reconnect, each ClientFD from the previous connection is re-derived on the
+// new connection on first use by walking its path from the new mount root and
+// re-opening it if needed. If the file no longer exists, or a different file
+// now exists at its path, the ClientFD is stale and all RPCs on it fail with
+// ESTALE.
+//
+// ClientFDs are values that are copied around freely, so they can't be
+// updated in place. Instead, each ClientFD records the generation of the
+// connection it was obtained on, and Client.remap maps re-derived ClientFDs to
+// their FD on the current connection.
+
+// fdKey identifies an FD across connections.
+type fdKey struct {
+	gen uint64
+	fd  FDID
+}
+
+// fdOrigin describes how an FD was obtained.
+type fdOrigin struct {
+	// path is the path of the file relative to the mount root.
+	path []string
+
+	// identity is true if devMajor, devMinor and ino identify the file.
+	identity bool
+	devMajor uint32
+	devMinor uint32
+	ino      uint64
+
+	// open is true for open FDs, which were opened with flags.
+	open  bool
+	flags uint32
+}
+
+// sameFile returns true if stat may describe the file that o represents.
+func (o *fdOrigin) sameFile(stat *linux.Statx) bool {
+	if !o.identity || stat.Mask&linux.STATX_INO == 0 {
+		return true
+	}
+	return o.devMajor == stat.DevMajor && o.devMinor == stat.DevMinor && o.ino == stat.Ino
+}
+
+// child returns the origin of the file name in the directory o represents,
+// whose Inode is inode.
+func (o *fdOrigin) child(name string, inode *Inode) *fdOrigin {
+	path := make([]string, len(o.path), len(o.path)+1)
+	copy(path, o.path)
+	return newOrigin(append(path, name), inode)
+}
+
+func newOrigin(path []string, inode *Inode) *fdOrigin {
+	o := &fdOrigin{path: path}
+	if inode.Stat.Mask&linux.STATX_INO != 0 {
+		o.identity = true
+		o.devMajor = inode.Stat.DevMajor
+		o.devMinor = inode.Stat.DevMinor
+		o.ino = inode.Stat.Ino
+	}
+	return o
+}
+
+// transportError wraps errors returned by communicators, which indicate that
+// the connection is broken, as opposed to errors returned by the server.
+type transportError struct {
+	err error
+}
+
+// Error implements error.Error.
+func (e transportError) Error() string {
+	return e.err.Error()
+}
+
+// EnableReconnect makes c survive the loss of its connection. RPCs made while
+// the connection is lost wait up to timeout for Reconnect to be called, after
+// which they fail with EINTR. onDisconnect, if not nil, is called from a new
+// goroutine every time the connection is lost.
+//
+// root must be the root Inode returned by NewClient. The root FD is kept open
+// until c is closed.
+//
+// Preconditions:
+//   - EnableReconnect must be called right after NewClient, before c is used.
+//   - timeout > 0.
+func (c *Client) EnableReconnect(root *Inode, timeout time.Duration, onDisconnect func()) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.reconnectTimeout = timeout
+	c.onDisconnect = onDisconnect
+	c.root = root.ControlFD
+	c.origins = map[FDID]*fdOrigin{root.ControlFD: newOrigin(nil, root)}
+	c.stale = make(map[fdKey]*fdOrigin)
+	c.remap = make(map[fdKey]fdKey)
+}
+
+// Reconnect re-establishes communication with the server over sock after the
+// connection was lost. The server must serve the same tree as the server of
+// the lost connection. Reconnect takes ownership of sock.
+//
+// Reconnect fails with EBUSY if the connection has not been lost, and with
+// ESTALE if the new server serves a different mount root.
+func (c *Client) Reconnect(sock *unet.Socket) error {
+	c.reconnectMu.Lock()
+	defer c.reconnectMu.Unlock()
+
+	c.connMu.Lock()
+	var err error
+	switch {
+	case c.reconnectTimeout == 0:
+		err = unix.EINVAL
+	case c.closed:
+		err = unix.EBADF
+	case !c.lost:
+		err = unix.EBUSY
+	}
+	c.connMu.Unlock()
+	if err != nil {
+		sock.Close()
+		return err
+	}
+
+	// Wait for the watchdog of the lost connection to finish cleaning up.
+	c.watchdogWg.Wait()
+	// FDs queued for closing belong to the lost connection.
+	c.fdsMu.Lock()
+	c.fdsToClose = c.fdsToClose[:0]
+	c.fdsMu.Unlock()
+
+	root, err := c.connect(sock, false /* first */)
+	if err != nil {
+		return err
+	}
+
+	c.connMu.Lock()
+	oldGen := c.generation
+	oldRoot := fdKey{gen: oldGen, fd: c.root}
+	if !c.origins[c.root].sameFile(&root.Stat) {
+		c.connMu.Unlock()
+		log.Warningf("lisafs: server serves a different mount root after reconnect")
+		c.sockComm.shutdown()
+		c.watchdogWg.Wait()
+		return unix.ESTALE
+	}
+	for fd, o := range c.origins {
+		if fd != c.root {
+			c.stale[fdKey{gen: oldGen, fd: fd}] = o
+		}
+	}
+	c.generation++
+	c.root = root.ControlFD
+	c.remap[oldRoot] = fdKey{gen: c.generation, fd: c.root}
+	c.origins = map[FDID]*fdOrigin{c.root: newOrigin(nil, &root)}
+	c.lost = false
+	numStale := len(c.stale)
+	c.connMu.Unlock()
+
+	log.Infof("lisafs: reconnected to server, %d FDs to re-derive", numStale)
+	c.connQueue.Notify(waiter.EventIn)
+	return nil
+}
+
+// connectionLost is called by the watchdog after the connection is lost.
+func (c *Client) connectionLost() {
+	if c.reconnectTimeout == 0 {
+		return
+	}
+	c.connMu.Lock()
+	if c.closed || c.lost {
+		c.connMu.Unlock()
+		return
+	}
+	c.lost = true
+	c.connMu.Unlock()
+
+	log.Warningf("lisafs: connection to server lost, RPCs will wait up to %v for a reconnect", c.reconnectTimeout)
+	if c.onDisconnect != nil {
+		go c.onDisconnect()
+	}
+}
+
+// checkSameServer checks that the server that sent resp supports the same
+// messages as the server of the first connection.
+func (c *Client) checkSameServer(resp *MountResp) error {
+	if uint32(resp.MaxMessageSize) != c.maxMessageSize {
+		log.Warningf("lisafs: new server has max message size %d, want %d", resp.MaxMessageSize, c.maxMessageSize)
+		return unix.EPROTO
+	}
+	supported := make([]bool, len(c.supported))
+	for _, m := range resp.SupportedMs {
+		if int(m) < len(supported) {
+			supported[m] = true
+		}
+	}
+	for m := range supported {
+		if supported[m] != c.supported[m] {
+			log.Warningf("lisafs: new server differs in support for message %d", m)
+			return unix.EPROTO
+		}
+	}
+	return nil
+}
+
+// currentGeneration returns the generation of the current connection.
+func (c *Client) currentGeneration() uint64 {
+	if c.reconnectTimeout == 0 {
+		return 0
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.generation
+}
+
+// peek returns the FD that key maps to on the current connection, if it has
+// been re-derived already.
+func (c *Client) peek(key fdKey) (FDID, bool) {
+	if c.reconnectTimeout == 0 {
+		return key.fd, true
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	for key.gen != c.generation {
+		next, ok := c.remap[key]
+		if !ok {
+			return InvalidFDID, false
+		}
+		key = next
+	}
+	return key.fd, true
+}
+
+// resolve returns the FD that key maps to on the current connection,
+// re-deriving it if needed. If the connection is lost, it waits for a
+// reconnect.
+func (c *Client) resolve(ctx context.Context, key fdKey) (FDID, error) {
+	for {
+		c.connMu.Lock()
+		if c.lost && !c.closed {
+			c.connMu.Unlock()
+			if err := c.awaitReconnect(ctx); err != nil {
+				return InvalidFDID, err
+			}
+			continue
+		}
+		gen := c.generation
+		for key.gen != gen {
+			next, ok := c.remap[key]
+			if !ok {
+				break
+			}
+			key = next
+		}
+		if key.gen == gen {
+			c.connMu.Unlock()
+			return key.fd, nil
+		}
+		origin, ok := c.stale[key]
+		c.connMu.Unlock()
+		if !ok {
+			return InvalidFDID, unix.ESTALE
+		}
+
+		fd, err := c.rederive(ctx, origin)
+
+		c.connMu.Lock()
+		if c.generation != gen {
+			// The connection was lost and re-established again, so fd (if
+			// any) is gone. Start over.
+			c.connMu.Unlock()
+			continue
+		}
+		if err != nil {
+			if err == unix.ESTALE {
+				delete(c.stale, key)
+			}
+			c.connMu.Unlock()
+			return InvalidFDID, err
+		}
+		if next, ok := c.remap[key]; ok {
+			// Another goroutine re-derived key concurrently.
+			c.connMu.Unlock()
+			c.CloseFD(ctx, fd, false /* flush */)
+			key = next
+			continue
+		}
+		if _, ok := c.stale[key]; !ok {
+			// key was closed concurrently.
+			c.connMu.Unlock()
+			c.CloseFD(ctx, fd, false /* flush */)
+			return InvalidFDID, unix.ESTALE
+		}
+		delete(c.stale, key)
+		c.remap[key] = fdKey{gen: gen, fd: fd}
+		c.connMu.Unlock()
+		return fd, nil
+	}
+}
+
+// rederive obtains an FD for the file described by o on the current
+// connection.
+func (c *Client) rederive(ctx context.Context, o *fdOrigin) (FDID, error) {
+	c.connMu.Lock()
+	root := ClientFD{client: c, fd: c.root, gen: c.generation}
+	c.connMu.Unlock()
+
+	control := root
+	if len(o.path) > 0 {
+		status, inodes, err := root.WalkMultiple(ctx, o.path)
+		if err != nil {
+			return InvalidFDID, err
+		}
+		for i := 0; i < len(inodes)-1; i++ {
+			fd := ClientFD{client: c, fd: inodes[i].ControlFD, gen: root.gen}
+			fd.Close(ctx, false /* flush */)
+		}
+		if len(inodes) == 0 {
+			return InvalidFDID, unix.ESTALE
+		}
+		last := &inodes[len(inodes)-1]
+		control = ClientFD{client: c, fd: last.ControlFD, gen: root.gen}
+		if status != WalkSuccess || len(inodes) != len(o.path) || !o.sameFile(&last.Stat) {
+			control.Close(ctx, false /* flush */)
+			return InvalidFDID, unix.ESTALE
+		}
+		if !o.open {
+			return control.fd, nil
+		}
+		defer control.Close(ctx, false /* flush */)
+	} else if !o.open {
+		return root.fd, nil
+	}
+
+	openFD, hostFD, err := control.OpenAt(ctx, o.flags)
+	if hostFD >= 0 {
+		// The host FD donated for the old FD remains usable.
+		_ = unix.Close(hostFD)
+	}
+	return openFD, err
+}
+
+// forget stops tracking the FD that key maps to, and returns it along with
+// true if it belongs to the current connection and must be closed.
+func (c *Client) forget(key fdKey) (FDID, bool) {
+	if c.reconnectTimeout == 0 {
+		return key.fd, true
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	for key.gen != c.generation {
+		delete(c.stale, key)
+		next, ok := c.remap[key]
+		if !ok {
+			return InvalidFDID, false
+		}
+		delete(c.remap, key)
+		key = next
+	}
+	return key.fd, true
+}
+
+// untrack stops tracking fd, and returns true if it must be closed on the
+// server.
+func (c *Client) untrack(fd FDID) bool {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if fd == c.root {
+		return false
+	}
+	delete(c.origins, fd)
+	return !c.lost
+}
+
+// trackChild records that child was obtained from dir by name.
+func (c *Client) trackChild(dir FDID, name string, child *Inode) {
+	if c.reconnectTimeout == 0 {
+		return
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if o, ok := c.origins[dir]; ok {
+		c.origins[child.ControlFD] = o.child(name, child)
+	}
+}
+
+// trackWalk records that inodes were obtained by walking names from dir.
+func (c *Client) trackWalk(dir FDID, names []string, inodes []Inode) {
+	if c.reconnectTimeout == 0 {
+		return
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	o, ok := c.origins[dir]
+	if !ok {
+		return
+	}
+	for i := range inodes {
+		o = o.child(names[i], &inodes[i])
+		c.origins[inodes[i].ControlFD] = o
+	}
+}
+
+// trackOpen records that openFD was obtained by opening control with flags.
+func (c *Client) trackOpen(control, openFD FDID, flags uint32) {
+	if c.reconnectTimeout == 0 {
+		return
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	o, ok := c.origins[control]
+	if !ok {
+		return
+	}
+	opened := *o
+	opened.open = true
+	// Re-opening must not create or truncate the file again.
+	opened.flags = flags &^ (unix.O_CREAT | unix.O_EXCL | unix.O_TRUNC)
+	c.origins[openFD] = &opened
+}
+
+// trackRename records that oldName in oldDir was renamed to newName in
+// newDir.
+func (c *Client) trackRename(oldDir FDID, oldName string, newDir FDID, newName string) {
+	if c.reconnectTimeout == 0 {
+		return
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	oldParent, ok := c.origins[oldDir]
+	if !ok {
+		return
+	}
+	newParent, ok := c.origins[newDir]
+	if !ok {
+		return
+	}
+	oldPath := append(append([]string(nil), oldParent.path...), oldName)
+	newPath := append(append([]string(nil), newParent.path...), newName)
+	rewrite := func(o *fdOrigin) {
+		if len(o.path) < len(oldPath) {
+			return
+		}
+		for i := range oldPath {
+			if o.path[i] != oldPath[i] {
+				return
+			}
+		}
+		path := make([]string, 0, len(newPath)+len(o.path)-len(oldPath))
+		path = append(path, newPath...)
+		o.path = append(path, o.path[len(oldPath):]...)
+	}
+	// Open FDs share nothing with their control FD, so each origin is
+	// rewritten exactly once.
+	for _, o := range c.origins {
+		rewrite(o)
+	}
+	for _, o := range c.stale {
+		rewrite(o)
+	}
+}
+
+// checkGeneration waits for a lost connection to be re-established, and
+// fails with ESTALE if the current connection is not generation gen.
+func (c *Client) checkGeneration(ctx context.Context, gen uint64) error {
+	if c.reconnectTimeout == 0 {
+		return nil
+	}
+	for {
+		c.connMu.Lock()
+		lost, cur := c.lost && !c.closed, c.generation
+		c.connMu.Unlock()
+		if lost {
+			if err := c.awaitReconnect(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if cur != gen {
+			return unix.ESTALE
+		}
+		return nil
+	}
+}
+
+// reconnectWaiter implements waiter.Waitable for waiting on a reconnect.
+type reconnectWaiter struct {
+	c *Client
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (w reconnectWaiter) Readiness(mask waiter.EventMask) waiter.EventMask {
+	w.c.connMu.Lock()
+	defer w.c.connMu.Unlock()
+	if w.c.lost && !w.c.closed {
+		return 0
+	}
+	return mask & waiter.EventIn
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (w reconnectWaiter) EventRegister(e *waiter.Entry) error {
+	w.c.connQueue.EventRegister(e)
+	// Don't miss a reconnect that happened before e was registered.
+	if w.Readiness(waiter.EventIn) != 0 {
+		e.NotifyEvent(waiter.EventIn)
+	}
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (w reconnectWaiter) EventUnregister(e *waiter.Entry) {
+	w.c.connQueue.EventUnregister(e)
+}
+
+// awaitReconnect waits for a lost connection to be re-established. It fails
+// with EINTR if ctx is interrupted or the reconnect timeout expires.
+func (c *Client) awaitReconnect(ctx context.Context) error {
+	w := reconnectWaiter{c}
+	deadline := time.Now().Add(c.reconnectTimeout)
+	for w.Readiness(waiter.EventIn) == 0 {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return unix.EINTR
+		}
+		if _, ok := ctx.BlockWithTimeoutOn(w, waiter.EventIn, timeout); !ok && w.Readiness(waiter.EventIn) == 0 {
+			return unix.EINTR
+		}
+	}
+	return nil
+}
+
+// awaitReconnectUninterruptible waits for the connection of generation gen to
+// be replaced, for up to the reconnect timeout.
+func (c *Client) awaitReconnectUninterruptible(gen uint64) {
+	e, ch := waiter.NewChannelEntry(waiter.EventIn)
+	c.connQueue.EventRegister(&e)
+	defer c.connQueue.EventUnregister(&e)
+	t := time.NewTimer(c.reconnectTimeout)
+	defer t.Stop()
+	for {
+		c.connMu.Lock()
+		done := c.closed || c.generation != gen
+		c.connMu.Unlock()
+		if done {
+			return
+		}
+		select {
+		case <-ch:
+		case <-t.C:
+			return
+		}
+	}
+}
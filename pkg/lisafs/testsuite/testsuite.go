@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"path"
 	"testing"
 	"time"
 
@@ -79,6 +80,8 @@ var localFSTests = map[string]TestFunc{
 	"Mknod":           testMknod,
 	"UDS":             testUDS,
 	"Getdents":        testGetdents,
+	"DonatePathFD":    testDonatePathFD,
+	"Delegate":        testDelegate,
 }
 
 // RunTest runs the passed test function as a subtest.
@@ -126,6 +129,127 @@ func RunTest(t *testing.T, tester Tester, testName string, testFn TestFunc, moun
 	server.Wait()
 }
 
+// RunReconnectTest checks that a client with reconnection enabled survives
+// the loss of its connection, and that FDs obtained on the lost connection
+// can be used on a new one unless their files were removed or replaced.
+func RunReconnectTest(t *testing.T, tester Tester) {
+	mountPath, err := ioutil.TempDir(os.Getenv("TEST_TMPDIR"), "")
+	if err != nil {
+		t.Fatalf("creation of temporary mountpoint failed: %v", err)
+	}
+	defer os.RemoveAll(mountPath)
+	refs.SetLeakMode(refs.LeaksPanic)
+	unix.Umask(0)
+
+	server := tester.NewServer(t)
+	connect := func() *unet.Socket {
+		serverSocket, clientSocket, err := unet.SocketPair(false)
+		if err != nil {
+			t.Fatalf("socketpair got err %v expected nil", err)
+		}
+		conn, err := server.CreateConnection(serverSocket, mountPath, false /* readonly */)
+		if err != nil {
+			t.Fatalf("starting connection failed: %v", err)
+		}
+		server.StartConnection(conn)
+		return clientSocket
+	}
+
+	clientSocket := connect()
+	c, root, err := lisafs.NewClient(clientSocket)
+	if err != nil {
+		t.Fatalf("client creation failed: %v", err)
+	}
+	c.EnableReconnect(&root, 100*time.Millisecond, nil /* onDisconnect */)
+	rootFile := c.NewFD(root.ControlFD)
+	ctx := context.Background()
+
+	data := []byte("survives reconnects")
+	kept, keptStat, keptOpen, keptHostFD := openCreateFile(ctx, t, rootFile, "kept")
+	unix.Close(keptHostFD)
+	if err := writeFD(ctx, t, keptOpen, 0, data); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	removed, _, removedOpen, removedHostFD := openCreateFile(ctx, t, rootFile, "removed")
+	unix.Close(removedHostFD)
+	closeFD(ctx, t, removedOpen)
+	replaced, _, replacedOpen, replacedHostFD := openCreateFile(ctx, t, rootFile, "replaced")
+	unix.Close(replacedHostFD)
+	closeFD(ctx, t, replacedOpen)
+	dir, _ := mkdir(ctx, t, rootFile, "dir")
+	child, childStat, childOpen, childHostFD := openCreateFile(ctx, t, dir, "child")
+	unix.Close(childHostFD)
+	closeFD(ctx, t, childOpen)
+	if err := rootFile.RenameAt(ctx, "dir", rootFile, "moved"); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+
+	// Lose the connection, and wait for RPCs to time out.
+	if err := clientSocket.Shutdown(); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	for {
+		var stat linux.Statx
+		err := kept.StatTo(ctx, &stat)
+		if err == unix.EINTR {
+			break
+		}
+		if err != nil {
+			t.Fatalf("stat on lost connection got err %v, want EINTR", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Change the tree while the client is disconnected.
+	if err := os.Remove(path.Join(mountPath, "removed")); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(mountPath, "new"), nil, 0777); err != nil {
+		t.Fatalf("write file failed: %v", err)
+	}
+	if err := os.Rename(path.Join(mountPath, "new"), path.Join(mountPath, "replaced")); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+
+	for {
+		err := c.Reconnect(connect())
+		if err == nil {
+			break
+		}
+		if err != unix.EBUSY {
+			t.Fatalf("reconnect failed: %v", err)
+		}
+		// The client hasn't noticed the loss of the connection yet.
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var stat linux.Statx
+	statTo(ctx, t, kept, &stat)
+	if stat.Ino != keptStat.Ino {
+		t.Errorf("inode number of kept file differs: want %d, got %d", keptStat.Ino, stat.Ino)
+	}
+	readFDAndCmp(ctx, t, keptOpen, 0, data)
+	statTo(ctx, t, child, &stat)
+	if stat.Ino != childStat.Ino {
+		t.Errorf("inode number of renamed file differs: want %d, got %d", childStat.Ino, stat.Ino)
+	}
+	statTo(ctx, t, rootFile, &stat)
+	if err := removed.StatTo(ctx, &stat); err != unix.ESTALE {
+		t.Errorf("stat on removed file got err %v, want ESTALE", err)
+	}
+	if err := replaced.StatTo(ctx, &stat); err != unix.ESTALE {
+		t.Errorf("stat on replaced file got err %v, want ESTALE", err)
+	}
+
+	for _, fd := range []lisafs.ClientFD{kept, keptOpen, removed, replaced, dir, child, rootFile} {
+		closeFD(ctx, t, fd)
+	}
+	server.Destroy()
+	refsvfs2.DoRepeatedLeakCheck()
+	c.Close()
+	server.Wait()
+}
+
 func closeFD(ctx context.Context, t testing.TB, fdLisa lisafs.ClientFD) {
 	fdLisa.Close(ctx, true /* flush */)
 }
@@ -178,7 +302,7 @@ func symlink(ctx context.Context, t *testing.T, dir lisafs.ClientFD, name, targe
 }
 
 func link(ctx context.Context, t *testing.T, dir lisafs.ClientFD, name string, target lisafs.ClientFD) (lisafs.ClientFD, linux.Statx) {
-	linkIno, err := dir.LinkAt(ctx, target.ID(), name)
+	linkIno, err := dir.LinkAt(ctx, target, name)
 	if err != nil {
 		t.Fatalf("link failed: %v", err)
 	}
@@ -436,6 +560,20 @@ func testAllocate(ctx context.Context, t *testing.T, tester Tester, root lisafs.
 
 	allocateAndVerify(ctx, t, fd, 0, 40)
 	allocateAndVerify(ctx, t, fd, 20, 100)
+
+	// The mode is passed through to the host, so holes can be punched.
+	data := bytes.Repeat([]byte{'a'}, 120)
+	if err := writeFD(ctx, t, fd, 0, data); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := fd.Allocate(ctx, unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, 20, 40); err == unix.EOPNOTSUPP {
+		t.Logf("host filesystem does not support FALLOC_FL_PUNCH_HOLE")
+		return
+	} else if err != nil {
+		t.Fatalf("fallocate(FALLOC_FL_PUNCH_HOLE) failed: %v", err)
+	}
+	copy(data[20:60], make([]byte, 40))
+	readFDAndCmp(ctx, t, fd, 0, data)
 }
 
 func testStatFS(ctx context.Context, t *testing.T, tester Tester, root lisafs.ClientFD) {
@@ -561,7 +699,7 @@ func testRename(ctx context.Context, t *testing.T, tester Tester, root lisafs.Cl
 	defer closeFD(ctx, t, tempDir)
 
 	// Move tempFile into tempDir.
-	if err := root.RenameAt(ctx, name, tempDir.ID(), "movedFile"); err != nil {
+	if err := root.RenameAt(ctx, name, tempDir, "movedFile"); err != nil {
 		t.Fatalf("rename failed: %v", err)
 	}
 
@@ -698,3 +836,76 @@ func testGetdents(ctx context.Context, t *testing.T, tester Tester, root lisafs.
 		}
 	}
 }
+
+func testDonatePathFD(ctx context.Context, t *testing.T, tester Tester, root lisafs.ClientFD) {
+	// Test connections are writable, so the server must refuse to donate host
+	// FDs that could be used to modify files behind its back.
+	if hostFD, err := root.DonatePathFD(ctx); err == nil {
+		unix.Close(hostFD)
+		t.Errorf("DonatePathFD on a writable connection succeeded, want error")
+	}
+}
+
+func testDelegate(ctx context.Context, t *testing.T, tester Tester, root lisafs.ClientFD) {
+	client := root.Client()
+	recalls := make(chan []lisafs.FDID, 16)
+	if !client.WatchRecalls(func(fds []lisafs.FDID) {
+		select {
+		case recalls <- fds:
+		default:
+		}
+	}) {
+		t.Skipf("server does not support delegations")
+	}
+	delegate := func(fd lisafs.ClientFD) {
+		granted, err := client.Delegate(ctx, []lisafs.FDID{fd.ID()})
+		if err != nil {
+			t.Fatalf("Delegate failed: %v", err)
+		}
+		if len(granted) != 1 || granted[0] != fd.ID() {
+			t.Fatalf("Delegate granted delegations on %v, want [%d]", granted, fd.ID())
+		}
+	}
+	waitRecall := func(fd lisafs.ClientFD) {
+		for {
+			select {
+			case fds := <-recalls:
+				for _, id := range fds {
+					if id == fd.ID() {
+						return
+					}
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("delegation on FD %d was not recalled", fd.ID())
+			}
+		}
+	}
+
+	dir, _ := mkdir(ctx, t, root, "dir")
+	defer closeFD(ctx, t, dir)
+
+	// Creating a file in the directory recalls the delegation.
+	delegate(dir)
+	file, _, fileFD, hostFD := openCreateFile(ctx, t, dir, "file")
+	defer closeFD(ctx, t, file)
+	defer closeFD(ctx, t, fileFD)
+	if hostFD >= 0 {
+		defer unix.Close(hostFD)
+	}
+	waitRecall(dir)
+
+	// So does modifying the file behind the server's back.
+	if hostFD >= 0 {
+		delegate(dir)
+		if _, err := unix.Pwrite(hostFD, []byte("hello"), 0); err != nil {
+			t.Fatalf("pwrite failed: %v", err)
+		}
+		waitRecall(dir)
+	}
+
+	// Delegations are only granted on directories.
+	if granted, err := client.Delegate(ctx, []lisafs.FDID{file.ID()}); err != nil || len(granted) != 0 {
+		t.Errorf("Delegate on a regular file: got (%v, %v), want ([], nil)", granted, err)
+	}
+	unlinkFile(ctx, t, dir, "file", false /* isDir */)
+}
@@ -215,14 +215,14 @@ func (l *BasicLogger) Warningf(format string, v ...interface{}) {
 
 // DebugfAtDepth logs at a specific depth.
 func (l *BasicLogger) DebugfAtDepth(depth int, format string, v ...interface{}) {
-	if l.IsLogging(Debug) {
+	if l.IsLogging(Debug) && callerEnabled(1+depth) {
 		l.Emit(1+depth, Debug, time.Now(), format, v...)
 	}
 }
 
 // InfofAtDepth logs at a specific depth.
 func (l *BasicLogger) InfofAtDepth(depth int, format string, v ...interface{}) {
-	if l.IsLogging(Info) {
+	if l.IsLogging(Info) && callerEnabled(1+depth) {
 		l.Emit(1+depth, Info, time.Now(), format, v...)
 	}
 }
@@ -103,3 +103,114 @@ func BenchmarkGoogleLogging(b *testing.B) {
 		bl.Debugf("hello %d, %d, %d", 1, 2, 3)
 	}
 }
+
+func TestRingBuffer(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		size   int
+		writes []string
+		want   string
+	}{
+		{name: "empty", size: 4, want: ""},
+		{name: "partial", size: 4, writes: []string{"ab"}, want: "ab"},
+		{name: "exact", size: 4, writes: []string{"ab", "cd"}, want: "abcd"},
+		{name: "wrap", size: 4, writes: []string{"abc", "def"}, want: "cdef"},
+		{name: "large write", size: 4, writes: []string{"a", "bcdefgh"}, want: "efgh"},
+		{name: "many writes", size: 3, writes: []string{"a", "b", "c", "d", "e"}, want: "cde"},
+		{name: "zero size", size: 0, writes: []string{"abc"}, want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRingBuffer(tc.size)
+			for _, w := range tc.writes {
+				if n, err := r.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v, want %d, nil", w, n, err, len(w))
+				}
+			}
+			var out strings.Builder
+			if _, err := r.WriteTo(&out); err != nil {
+				t.Fatalf("WriteTo failed: %v", err)
+			}
+			if got := out.String(); got != tc.want {
+				t.Errorf("WriteTo wrote %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRingEmitter(t *testing.T) {
+	r := NewRingEmitter(3)
+	bl := &BasicLogger{
+		Emitter: r,
+		Level:   Debug,
+	}
+
+	entries, next, wait := r.Read(0)
+	if len(entries) != 0 || next != 0 || wait == nil {
+		t.Fatalf("Read(0) = %v, %d, %v, want no entries, 0 and a channel", entries, next, wait)
+	}
+	bl.Infof("entry %d", 0)
+	select {
+	case <-wait:
+	default:
+		t.Errorf("channel returned by Read wasn't closed by Emit")
+	}
+
+	for i := 1; i < 5; i++ {
+		bl.Debugf("entry %d", i)
+	}
+	entries, next, _ = r.Read(0)
+	if next != 5 {
+		t.Errorf("Read(0) returned next %d, want 5", next)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Message)
+		if e.Level != Debug {
+			t.Errorf("entry %q has level %v, want %v", e.Message, e.Level, Debug)
+		}
+		if e.Subsystem != Other {
+			t.Errorf("entry %q has subsystem %v, want %v", e.Message, e.Subsystem, Other)
+		}
+	}
+	if want := []string{"entry 2", "entry 3", "entry 4"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Read(0) returned entries %v, want %v", got, want)
+	}
+	if entries, _, _ := r.Read(4); len(entries) != 1 || entries[0].Message != "entry 4" {
+		t.Errorf("Read(4) returned entries %v, want only entry 4", entries)
+	}
+}
+
+func TestSubsystemFilter(t *testing.T) {
+	defer SetSubsystems(nil)
+
+	r := NewRingEmitter(10)
+	bl := &BasicLogger{
+		Emitter: r,
+		Level:   Debug,
+	}
+	SetSubsystems([]Subsystem{Netstack})
+	bl.Debugf("filtered")
+	bl.Warningf("not filtered")
+	SetSubsystems([]Subsystem{Netstack, Other})
+	bl.Infof("enabled")
+
+	var got []string
+	entries, _, _ := r.Read(0)
+	for _, e := range entries {
+		got = append(got, e.Message)
+	}
+	if want := []string{"not filtered", "enabled"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got entries %v, want %v", got, want)
+	}
+}
+
+func TestParseSubsystem(t *testing.T) {
+	for s := Other; s < numSubsystems; s++ {
+		if got, err := ParseSubsystem(s.String()); got != s || err != nil {
+			t.Errorf("ParseSubsystem(%q) = %v, %v, want %v, nil", s.String(), got, err, s)
+		}
+	}
+	if _, err := ParseSubsystem("foo"); err == nil {
+		t.Errorf("ParseSubsystem(\"foo\") succeeded, want error")
+	}
+}
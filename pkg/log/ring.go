@@ -0,0 +1,203 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// RingBuffer is an io.Writer that keeps the last bytes written to it, e.g. to
+// retain recent log messages for debugging.
+type RingBuffer struct {
+	mu sync.Mutex
+
+	// buf holds the retained bytes. Once buf is full, the oldest byte is at
+	// buf[next].
+	// +checklocks:mu
+	buf []byte
+
+	// next is the index in buf where the next byte is written.
+	// +checklocks:mu
+	next int
+
+	// full is true once buf has been filled.
+	// +checklocks:mu
+	full bool
+}
+
+// NewRingBuffer returns a RingBuffer that keeps the last size bytes written to
+// it.
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{buf: make([]byte, size)}
+}
+
+// Write implements io.Writer.Write.
+func (r *RingBuffer) Write(data []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(data)
+	if len(r.buf) == 0 {
+		return n, nil
+	}
+	if len(data) >= len(r.buf) {
+		copy(r.buf, data[len(data)-len(r.buf):])
+		r.next = 0
+		r.full = true
+		return n, nil
+	}
+	c := copy(r.buf[r.next:], data)
+	if c < len(data) {
+		copy(r.buf, data[c:])
+		r.full = true
+	}
+	r.next = (r.next + len(data)) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+	return n, nil
+}
+
+// WriteTo implements io.WriterTo.WriteTo. It writes the retained bytes, from
+// oldest to newest, to w.
+func (r *RingBuffer) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	var data []byte
+	if r.full {
+		data = append(data, r.buf[r.next:]...)
+	}
+	data = append(data, r.buf[:r.next]...)
+	r.mu.Unlock()
+
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// Entry is a log statement retained by a RingEmitter.
+type Entry struct {
+	// Time is when the statement was logged.
+	Time time.Time
+
+	// Level is the level the statement was logged at.
+	Level Level
+
+	// Subsystem is the subsystem that logged the statement.
+	Subsystem Subsystem
+
+	// Message is the formatted statement.
+	Message string
+}
+
+// String formats the entry like GoogleEmitter, with the subsystem in place of
+// the thread ID and the caller.
+func (e *Entry) String() string {
+	prefix := byte('?')
+	switch e.Level {
+	case Debug:
+		prefix = byte('D')
+	case Info:
+		prefix = byte('I')
+	case Warning:
+		prefix = byte('W')
+	}
+	_, month, day := e.Time.Date()
+	hour, minute, second := e.Time.Clock()
+	microsecond := int(e.Time.Nanosecond() / 1000)
+	return fmt.Sprintf("%c%02d%02d %02d:%02d:%02d.%06d %s] %s", prefix, int(month), day, hour, minute, second, microsecond, e.Subsystem, e.Message)
+}
+
+// RingEmitter is an Emitter that keeps the last log statements emitted to it,
+// so that they can be retrieved, or followed as they are emitted, without
+// writing them anywhere.
+type RingEmitter struct {
+	mu sync.Mutex
+
+	// entries holds the retained entries. The entry with sequence number seq
+	// is at entries[seq%len(entries)].
+	// +checklocks:mu
+	entries []Entry
+
+	// next is the sequence number of the next entry emitted.
+	// +checklocks:mu
+	next uint64
+
+	// notify, if not nil, is closed when the next entry is emitted.
+	// +checklocks:mu
+	notify chan struct{}
+}
+
+// NewRingEmitter returns a RingEmitter that keeps the last size entries
+// emitted to it.
+func NewRingEmitter(size int) *RingEmitter {
+	return &RingEmitter{entries: make([]Entry, size)}
+}
+
+// Emit implements Emitter.Emit.
+func (r *RingEmitter) Emit(depth int, level Level, timestamp time.Time, format string, v ...interface{}) {
+	e := Entry{
+		Time:      timestamp,
+		Level:     level,
+		Subsystem: callerSubsystem(1 + depth),
+		Message:   fmt.Sprintf(format, v...),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == 0 {
+		return
+	}
+	r.entries[r.next%uint64(len(r.entries))] = e
+	r.next++
+	if r.notify != nil {
+		close(r.notify)
+		r.notify = nil
+	}
+}
+
+// End returns the sequence number of the next entry emitted.
+func (r *RingEmitter) End() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.next
+}
+
+// Read returns the retained entries with sequence numbers of at least from,
+// oldest first, and the sequence number of the next entry emitted. Entries
+// that are no longer retained are skipped; the caller can detect this by
+// comparing from to next-len(entries).
+//
+// If there are no such entries, Read instead returns a channel that is closed
+// when the next entry is emitted.
+func (r *RingEmitter) Read(from uint64) ([]Entry, uint64, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if from >= r.next {
+		if r.notify == nil {
+			r.notify = make(chan struct{})
+		}
+		return nil, r.next, r.notify
+	}
+	if n := uint64(len(r.entries)); r.next > n && from < r.next-n {
+		from = r.next - n
+	}
+	entries := make([]Entry, 0, r.next-from)
+	for seq := from; seq < r.next; seq++ {
+		entries = append(entries, r.entries[seq%uint64(len(r.entries))])
+	}
+	return entries, r.next, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// Subsystem identifies the part of the sandbox that a log statement was
+// emitted by. It is derived from the package of the caller, so that log
+// statements don't need to be tagged explicitly.
+type Subsystem uint32
+
+// The following subsystems are recognized. Log statements from any other
+// package are attributed to Other.
+const (
+	// Other is any subsystem not listed below.
+	Other Subsystem = iota
+
+	// Kernel is the sentry kernel, memory manager and syscall
+	// implementations.
+	Kernel
+
+	// Gofer is the gofer client, i.e. the gofer filesystem and the
+	// protocols it speaks.
+	Gofer
+
+	// Netstack is the network stack and the sentry sockets built on it.
+	Netstack
+
+	// Platform is the platform and ring0.
+	Platform
+
+	numSubsystems
+)
+
+var subsystemNames = [...]string{
+	Other:    "other",
+	Kernel:   "kernel",
+	Gofer:    "gofer",
+	Netstack: "netstack",
+	Platform: "platform",
+}
+
+func (s Subsystem) String() string {
+	if s < numSubsystems {
+		return subsystemNames[s]
+	}
+	return fmt.Sprintf("Invalid subsystem: %d", uint32(s))
+}
+
+// ParseSubsystem returns the Subsystem with the given name.
+func ParseSubsystem(name string) (Subsystem, error) {
+	for s, n := range subsystemNames {
+		if n == name {
+			return Subsystem(s), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log subsystem %q", name)
+}
+
+// subsystemPackages maps package path prefixes to the subsystem they belong
+// to.
+var subsystemPackages = []struct {
+	prefix    string
+	subsystem Subsystem
+}{
+	{"gvisor.dev/gvisor/pkg/sentry/kernel", Kernel},
+	{"gvisor.dev/gvisor/pkg/sentry/mm", Kernel},
+	{"gvisor.dev/gvisor/pkg/sentry/loader", Kernel},
+	{"gvisor.dev/gvisor/pkg/sentry/syscalls", Kernel},
+	{"gvisor.dev/gvisor/pkg/sentry/fsimpl/gofer", Gofer},
+	{"gvisor.dev/gvisor/pkg/lisafs", Gofer},
+	{"gvisor.dev/gvisor/pkg/p9", Gofer},
+	{"gvisor.dev/gvisor/pkg/tcpip", Netstack},
+	{"gvisor.dev/gvisor/pkg/sentry/socket/netstack", Netstack},
+	{"gvisor.dev/gvisor/pkg/sentry/platform", Platform},
+	{"gvisor.dev/gvisor/pkg/ring0", Platform},
+}
+
+// callerSubsystem returns the subsystem of the caller at the given depth,
+// where 0 is the caller of callerSubsystem.
+func callerSubsystem(depth int) Subsystem {
+	pc, _, _, ok := runtime.Caller(depth + 1)
+	if !ok {
+		return Other
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return Other
+	}
+	name := fn.Name()
+	for _, p := range subsystemPackages {
+		if strings.HasPrefix(name, p.prefix) {
+			return p.subsystem
+		}
+	}
+	return Other
+}
+
+// subsystemFilter is the set of subsystems that debug and info statements are
+// logged for, as a bitmask indexed by Subsystem. Zero means all subsystems
+// are logged.
+var subsystemFilter uint32
+
+// SetSubsystems limits debug and info logging to the given subsystems.
+// Warnings are always logged. If subsystems is empty, all subsystems are
+// logged.
+func SetSubsystems(subsystems []Subsystem) {
+	var filter uint32
+	for _, s := range subsystems {
+		filter |= 1 << s
+	}
+	atomic.StoreUint32(&subsystemFilter, filter)
+}
+
+// SubsystemEnabled returns whether debug and info statements are logged for
+// the given subsystem.
+func SubsystemEnabled(s Subsystem) bool {
+	filter := atomic.LoadUint32(&subsystemFilter)
+	return filter == 0 || filter&(1<<s) != 0
+}
+
+// callerEnabled returns whether debug and info statements are logged for the
+// caller at the given depth, where 0 is the caller of callerEnabled.
+func callerEnabled(depth int) bool {
+	if atomic.LoadUint32(&subsystemFilter) == 0 {
+		// Avoid looking up the caller if there's nothing to filter.
+		return true
+	}
+	return SubsystemEnabled(callerSubsystem(1 + depth))
+}
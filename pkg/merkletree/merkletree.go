@@ -0,0 +1,357 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package merkletree implements Merkle trees used to verify the integrity of
+// files on verity mounts, and the descriptors that bind files to their trees.
+//
+// The tree of a file is built over its data split into BlockSize blocks, the
+// last of which is zero-padded. Level 0 of the tree holds the digests of the
+// data blocks; each higher level holds the digests of the blocks of the level
+// below it, until a level fits in a single block. The root digest is the
+// digest of that block. As in dm-verity, the tree is stored with the highest
+// level first, and each level is zero-padded to a multiple of BlockSize.
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// BlockSize is the size of both data blocks and tree blocks.
+	BlockSize = 4096
+
+	// DigestSize is the size of a digest.
+	DigestSize = sha256.Size
+
+	// digestsPerBlock is the number of digests in a tree block.
+	digestsPerBlock = BlockSize / DigestSize
+)
+
+// ErrMismatch is returned (possibly wrapped) when data does not match its
+// Merkle tree or descriptor.
+var ErrMismatch = errors.New("merkletree: digest mismatch")
+
+// Layout describes the shape of the Merkle tree for data of a given size.
+type Layout struct {
+	dataSize int64
+
+	// levelOffset[i] and levelBlocks[i] are the offset and number of blocks
+	// of level i of the tree, where level 0 holds the digests of data blocks.
+	levelOffset []int64
+	levelBlocks []int64
+
+	// treeSize is the total size of the tree.
+	treeSize int64
+}
+
+// NewLayout returns the layout of the Merkle tree for dataSize bytes of data.
+func NewLayout(dataSize int64) Layout {
+	// Empty data is treated as a single zero block, so that every tree has
+	// at least one level.
+	blocks := divRoundUp(dataSize, BlockSize)
+	if blocks == 0 {
+		blocks = 1
+	}
+	var levelBlocks []int64
+	for {
+		blocks = divRoundUp(blocks, digestsPerBlock)
+		levelBlocks = append(levelBlocks, blocks)
+		if blocks == 1 {
+			break
+		}
+	}
+	l := Layout{
+		dataSize:    dataSize,
+		levelOffset: make([]int64, len(levelBlocks)),
+		levelBlocks: levelBlocks,
+	}
+	for i := len(levelBlocks) - 1; i >= 0; i-- {
+		l.levelOffset[i] = l.treeSize
+		l.treeSize += levelBlocks[i] * BlockSize
+	}
+	return l
+}
+
+// DataSize returns the size of the data described by l.
+func (l Layout) DataSize() int64 {
+	return l.dataSize
+}
+
+// TreeSize returns the size of the tree described by l.
+func (l Layout) TreeSize() int64 {
+	return l.treeSize
+}
+
+// blockOffset returns the offset in the tree of the block holding the digest
+// of block index at the given level (where level 0 holds the digests of data
+// blocks), and the offset of the digest within that block.
+func (l Layout) blockOffset(level int, index int64) (int64, int) {
+	return l.levelOffset[level] + (index/digestsPerBlock)*BlockSize, int(index%digestsPerBlock) * DigestSize
+}
+
+// Digest returns the digest of a block. If b is shorter than BlockSize, it is
+// zero-padded.
+func Digest(b []byte) []byte {
+	h := sha256.New()
+	h.Write(b)
+	if len(b) < BlockSize {
+		var zeroes [BlockSize]byte
+		h.Write(zeroes[:BlockSize-len(b)])
+	}
+	return h.Sum(nil)
+}
+
+// Generate reads size bytes of data from r and returns its Merkle tree and
+// root digest.
+func Generate(r io.Reader, size int64) (tree, root []byte, err error) {
+	l := NewLayout(size)
+	tree = make([]byte, l.treeSize)
+
+	// Fill level 0 from the data.
+	buf := make([]byte, BlockSize)
+	var index int64
+	for off := int64(0); off < size || index == 0; off += BlockSize {
+		n := int64(BlockSize)
+		if size-off < n {
+			n = size - off
+		}
+		if _, err := io.ReadFull(r, buf[:n]); err != nil {
+			return nil, nil, fmt.Errorf("reading data at offset %d: %w", off, err)
+		}
+		blockOff, digestOff := l.blockOffset(0, index)
+		copy(tree[blockOff+int64(digestOff):], Digest(buf[:n]))
+		index++
+	}
+
+	// Fill each higher level from the blocks of the level below it.
+	for level := 1; level < len(l.levelOffset); level++ {
+		below := l.levelOffset[level-1]
+		for i := int64(0); i < l.levelBlocks[level-1]; i++ {
+			blockOff, digestOff := l.blockOffset(level, i)
+			copy(tree[blockOff+int64(digestOff):], Digest(tree[below+i*BlockSize:below+(i+1)*BlockSize]))
+		}
+	}
+	top := l.levelOffset[len(l.levelOffset)-1]
+	return tree, Digest(tree[top : top+BlockSize]), nil
+}
+
+// VerifyTree checks that tree is the Merkle tree described by l with the given
+// root digest. Once tree has been checked, VerifyData can check data against
+// it without rehashing the higher levels of the tree.
+func VerifyTree(l Layout, tree, root []byte) error {
+	if int64(len(tree)) != l.treeSize {
+		return fmt.Errorf("%w: tree has size %d, want %d", ErrMismatch, len(tree), l.treeSize)
+	}
+	top := l.levelOffset[len(l.levelOffset)-1]
+	if !bytes.Equal(Digest(tree[top:top+BlockSize]), root) {
+		return fmt.Errorf("%w: root digest", ErrMismatch)
+	}
+	for level := 1; level < len(l.levelOffset); level++ {
+		below := l.levelOffset[level-1]
+		for i := int64(0); i < l.levelBlocks[level-1]; i++ {
+			blockOff, digestOff := l.blockOffset(level, i)
+			want := tree[blockOff+int64(digestOff) : blockOff+int64(digestOff)+DigestSize]
+			if !bytes.Equal(Digest(tree[below+i*BlockSize:below+(i+1)*BlockSize]), want) {
+				return fmt.Errorf("%w: tree level %d block %d", ErrMismatch, level-1, i)
+			}
+		}
+	}
+	return nil
+}
+
+// VerifyData checks data read from offset off in a file against tree, which
+// must already have been checked by VerifyTree. off must be a multiple of
+// BlockSize, and data must either have a length that is a multiple of
+// BlockSize or end at the end of the file.
+func VerifyData(l Layout, tree []byte, off int64, data []byte) error {
+	if off%BlockSize != 0 {
+		return fmt.Errorf("unaligned offset %d", off)
+	}
+	end := off + int64(len(data))
+	if end > l.dataSize || (end%BlockSize != 0 && end != l.dataSize) {
+		return fmt.Errorf("%w: data range [%d, %d) does not match file size %d", ErrMismatch, off, end, l.dataSize)
+	}
+	for len(data) > 0 {
+		n := BlockSize
+		if len(data) < n {
+			n = len(data)
+		}
+		index := off / BlockSize
+		blockOff, digestOff := l.blockOffset(0, index)
+		want := tree[blockOff+int64(digestOff) : blockOff+int64(digestOff)+DigestSize]
+		if !bytes.Equal(Digest(data[:n]), want) {
+			return fmt.Errorf("%w: data block %d", ErrMismatch, index)
+		}
+		data = data[n:]
+		off += int64(n)
+	}
+	return nil
+}
+
+// TreeFilePrefix is the prefix of the names of tree files, which hold the
+// descriptors of the files on a verity mount. Tree files are hidden from the
+// application.
+const TreeFilePrefix = ".merkle.verity"
+
+// TreeFileName returns the name of the tree file for the file with the given
+// name, which is held in the same directory. The tree file for the root of a
+// mount, which has no name, is TreeFilePrefix in the root directory.
+func TreeFileName(name string) string {
+	if name == "" {
+		return TreeFilePrefix
+	}
+	return TreeFilePrefix + "." + name
+}
+
+// IsTreeFileName returns true if name is the name of a tree file.
+func IsTreeFileName(name string) bool {
+	return strings.HasPrefix(name, TreeFilePrefix)
+}
+
+const (
+	descriptorMagic   = "gvverity"
+	descriptorVersion = 1
+
+	// DescriptorSize is the size of an encoded Descriptor.
+	DescriptorSize = 64
+)
+
+// Descriptor describes a file on a verity mount. A tree file consists of the
+// file's encoded Descriptor followed by its payload: for regular files, the
+// Merkle tree of the file's contents; for directories, the encoded listing of
+// its children (see EncodeDirectory); and for symbolic links, the link's
+// target. The data covered by Root is the file's contents for regular files,
+// and its payload otherwise.
+//
+// The digest of the root directory's descriptor is the root hash of the mount.
+type Descriptor struct {
+	// Mode is the file's type and permissions.
+	Mode uint32
+
+	// UID and GID are the file's owner and group.
+	UID uint32
+	GID uint32
+
+	// Size is the size of the data covered by Root.
+	Size int64
+
+	// Root is the root digest of the Merkle tree of the file's data.
+	Root []byte
+}
+
+// Encode returns the encoding of d.
+func (d *Descriptor) Encode() []byte {
+	b := make([]byte, DescriptorSize)
+	copy(b, descriptorMagic)
+	binary.LittleEndian.PutUint32(b[8:], descriptorVersion)
+	binary.LittleEndian.PutUint32(b[12:], d.Mode)
+	binary.LittleEndian.PutUint32(b[16:], d.UID)
+	binary.LittleEndian.PutUint32(b[20:], d.GID)
+	binary.LittleEndian.PutUint64(b[24:], uint64(d.Size))
+	copy(b[32:], d.Root)
+	return b
+}
+
+// Digest returns the digest of d, which is recorded in the listing of its
+// parent directory.
+func (d *Descriptor) Digest() []byte {
+	sum := sha256.Sum256(d.Encode())
+	return sum[:]
+}
+
+// DecodeDescriptor decodes the Descriptor at the beginning of b.
+func DecodeDescriptor(b []byte) (Descriptor, error) {
+	if len(b) < DescriptorSize {
+		return Descriptor{}, fmt.Errorf("descriptor has size %d, want at least %d", len(b), DescriptorSize)
+	}
+	if string(b[:8]) != descriptorMagic {
+		return Descriptor{}, fmt.Errorf("descriptor has invalid magic %q", b[:8])
+	}
+	if v := binary.LittleEndian.Uint32(b[8:]); v != descriptorVersion {
+		return Descriptor{}, fmt.Errorf("descriptor has unsupported version %d", v)
+	}
+	d := Descriptor{
+		Mode: binary.LittleEndian.Uint32(b[12:]),
+		UID:  binary.LittleEndian.Uint32(b[16:]),
+		GID:  binary.LittleEndian.Uint32(b[20:]),
+		Size: int64(binary.LittleEndian.Uint64(b[24:])),
+		Root: append([]byte(nil), b[32:DescriptorSize]...),
+	}
+	if d.Size < 0 {
+		return Descriptor{}, fmt.Errorf("descriptor has invalid size %d", d.Size)
+	}
+	return d, nil
+}
+
+// DirEntry is an entry in the listing of a directory on a verity mount.
+type DirEntry struct {
+	// Name is the name of the child.
+	Name string
+
+	// Digest is the digest of the child's Descriptor.
+	Digest []byte
+}
+
+// EncodeDirectory returns the encoding of a directory listing. Entries are
+// encoded in order of name, so the encoding does not depend on the order of
+// ents.
+func EncodeDirectory(ents []DirEntry) []byte {
+	sorted := append([]DirEntry(nil), ents...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	var buf bytes.Buffer
+	for _, ent := range sorted {
+		var n [2]byte
+		binary.LittleEndian.PutUint16(n[:], uint16(len(ent.Name)))
+		buf.Write(n[:])
+		buf.WriteString(ent.Name)
+		buf.Write(ent.Digest)
+	}
+	return buf.Bytes()
+}
+
+// DecodeDirectory decodes a directory listing encoded by EncodeDirectory.
+func DecodeDirectory(b []byte) ([]DirEntry, error) {
+	var ents []DirEntry
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("truncated directory entry")
+		}
+		n := int(binary.LittleEndian.Uint16(b))
+		b = b[2:]
+		if n == 0 || len(b) < n+DigestSize {
+			return nil, fmt.Errorf("invalid directory entry")
+		}
+		ent := DirEntry{
+			Name:   string(b[:n]),
+			Digest: append([]byte(nil), b[n:n+DigestSize]...),
+		}
+		if len(ents) != 0 && ents[len(ents)-1].Name >= ent.Name {
+			return nil, fmt.Errorf("directory entries are not sorted")
+		}
+		ents = append(ents, ent)
+		b = b[n+DigestSize:]
+	}
+	return ents, nil
+}
+
+func divRoundUp(x, y int64) int64 {
+	return (x + y - 1) / y
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	for _, tc := range []struct {
+		dataSize   int64
+		wantLevels int
+		wantSize   int64
+	}{
+		{dataSize: 0, wantLevels: 1, wantSize: BlockSize},
+		{dataSize: 1, wantLevels: 1, wantSize: BlockSize},
+		{dataSize: BlockSize * digestsPerBlock, wantLevels: 1, wantSize: BlockSize},
+		{dataSize: BlockSize*digestsPerBlock + 1, wantLevels: 2, wantSize: 3 * BlockSize},
+		{dataSize: BlockSize * digestsPerBlock * digestsPerBlock, wantLevels: 2, wantSize: (digestsPerBlock + 1) * BlockSize},
+	} {
+		l := NewLayout(tc.dataSize)
+		if got := len(l.levelOffset); got != tc.wantLevels {
+			t.Errorf("NewLayout(%d) has %d levels, want %d", tc.dataSize, got, tc.wantLevels)
+		}
+		if got := l.TreeSize(); got != tc.wantSize {
+			t.Errorf("NewLayout(%d).TreeSize() = %d, want %d", tc.dataSize, got, tc.wantSize)
+		}
+		// The highest level is stored first.
+		if got := l.levelOffset[len(l.levelOffset)-1]; got != 0 {
+			t.Errorf("NewLayout(%d) stores its highest level at %d, want 0", tc.dataSize, got)
+		}
+	}
+}
+
+func TestGenerateAndVerify(t *testing.T) {
+	for _, size := range []int64{0, 1, BlockSize - 1, BlockSize, BlockSize + 1, BlockSize*digestsPerBlock + 3*BlockSize + 5} {
+		data := make([]byte, size)
+		rand.Read(data)
+		tree, root, err := Generate(bytes.NewReader(data), size)
+		if err != nil {
+			t.Fatalf("Generate(size=%d) failed: %v", size, err)
+		}
+		l := NewLayout(size)
+		if err := VerifyTree(l, tree, root); err != nil {
+			t.Errorf("VerifyTree(size=%d) failed: %v", size, err)
+		}
+		// Verify each block separately, and then all of them at once.
+		for off := int64(0); off < size; off += BlockSize {
+			end := off + BlockSize
+			if end > size {
+				end = size
+			}
+			if err := VerifyData(l, tree, off, data[off:end]); err != nil {
+				t.Errorf("VerifyData(size=%d, off=%d) failed: %v", size, off, err)
+			}
+		}
+		if err := VerifyData(l, tree, 0, data); err != nil {
+			t.Errorf("VerifyData(size=%d) failed: %v", size, err)
+		}
+
+		if size == 0 {
+			continue
+		}
+		// Flip a bit in the data.
+		bad := append([]byte(nil), data...)
+		bad[size/2] ^= 1
+		if err := VerifyData(l, tree, 0, bad); !errors.Is(err, ErrMismatch) {
+			t.Errorf("VerifyData(size=%d) with corrupted data got %v, want %v", size, err, ErrMismatch)
+		}
+		// Flip a bit in the tree.
+		badTree := append([]byte(nil), tree...)
+		badTree[len(badTree)-1] ^= 1
+		if err := VerifyTree(l, badTree, root); !errors.Is(err, ErrMismatch) {
+			t.Errorf("VerifyTree(size=%d) with corrupted tree got %v, want %v", size, err, ErrMismatch)
+		}
+		// Truncate the data within a block.
+		if (size-1)%BlockSize == 0 {
+			continue
+		}
+		if err := VerifyData(l, tree, 0, data[:size-1]); !errors.Is(err, ErrMismatch) {
+			t.Errorf("VerifyData(size=%d) with truncated data got %v, want %v", size, err, ErrMismatch)
+		}
+	}
+}
+
+func TestDescriptor(t *testing.T) {
+	d := Descriptor{
+		Mode: 0100644,
+		UID:  1,
+		GID:  2,
+		Size: 12345,
+		Root: Digest([]byte("root")),
+	}
+	b := d.Encode()
+	if len(b) != DescriptorSize {
+		t.Fatalf("Encode() has size %d, want %d", len(b), DescriptorSize)
+	}
+	got, err := DecodeDescriptor(b)
+	if err != nil {
+		t.Fatalf("DecodeDescriptor failed: %v", err)
+	}
+	if !bytes.Equal(got.Digest(), d.Digest()) {
+		t.Errorf("DecodeDescriptor() = %+v, want %+v", got, d)
+	}
+	b[0] ^= 1
+	if _, err := DecodeDescriptor(b); err == nil {
+		t.Errorf("DecodeDescriptor with invalid magic succeeded")
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	ents := []DirEntry{
+		{Name: "b", Digest: Digest([]byte("b"))},
+		{Name: "a", Digest: Digest([]byte("a"))},
+		{Name: "c", Digest: Digest([]byte("c"))},
+	}
+	got, err := DecodeDirectory(EncodeDirectory(ents))
+	if err != nil {
+		t.Fatalf("DecodeDirectory failed: %v", err)
+	}
+	if len(got) != len(ents) {
+		t.Fatalf("DecodeDirectory returned %d entries, want %d", len(got), len(ents))
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		if got[i].Name != name || !bytes.Equal(got[i].Digest, Digest([]byte(name))) {
+			t.Errorf("entry %d = %+v, want name %q", i, got[i], name)
+		}
+	}
+}
+
+func TestTreeFileName(t *testing.T) {
+	if !IsTreeFileName(TreeFileName("")) || !IsTreeFileName(TreeFileName("foo")) {
+		t.Errorf("tree file names are not recognized")
+	}
+	if TreeFileName("") == TreeFileName("root") {
+		t.Errorf("root tree file name collides with a child's")
+	}
+	if IsTreeFileName("foo") {
+		t.Errorf("IsTreeFileName(%q) = true, want false", "foo")
+	}
+}
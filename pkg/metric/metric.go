@@ -686,14 +686,23 @@ func MustCreateNewDistributionMetric(name string, sync bool, bucketer Bucketer,
 //
 //go:nosplit
 func (d *DistributionMetric) AddSample(sample int64, fields ...string) {
-	d.addSampleByKey(sample, d.fieldsToKey.lookup(fields...))
+	d.AddSampleByKey(sample, d.fieldsToKey.lookup(fields...))
 }
 
-// addSampleByKey works like AddSample, with the field key already known.
+// FieldKey returns the key of the given combination of field values, for use
+// with AddSampleByKey. This allows callers that add samples in hot paths to
+// look up the key of each combination of fields ahead of time.
+// This *must* be called with the correct number of fields, or it will panic.
+func (d *DistributionMetric) FieldKey(fields ...string) int {
+	return d.fieldsToKey.lookup(fields...)
+}
+
+// AddSampleByKey works like AddSample, with the field key already known.
+// key must have been returned by d.FieldKey.
 // +checkescape:all
 //
 //go:nosplit
-func (d *DistributionMetric) addSampleByKey(sample int64, key int) {
+func (d *DistributionMetric) AddSampleByKey(sample int64, key int) {
 	bucket := d.exponentialBucketer.BucketIndex(sample)
 	d.samples[key][bucket+1].Add(1)
 }
@@ -791,7 +800,7 @@ func (t *TimerMetric) Start(fields ...string) TimedOperation {
 func (o TimedOperation) Finish(extraFields ...string) {
 	ended := CheapNowNano()
 	fieldKey := o.metric.fieldsToKey.lookupConcat(o.partialFields, extraFields)
-	o.metric.addSampleByKey(ended-o.startedNs, fieldKey)
+	o.metric.AddSampleByKey(ended-o.startedNs, fieldKey)
 }
 
 // stageTiming contains timing data for an initialization stage.
@@ -910,3 +910,33 @@ func TestFieldMapperNoFields(t *testing.T) {
 		t.Errorf("keyToMultiField using key %v (corresponding to no field values): expected no values, got some", key)
 	}
 }
+
+// BenchmarkTimerMetricManyFieldValues measures the cost of recording a sample
+// in a timer metric with a field with many allowed values, such as one value
+// per syscall.
+func BenchmarkTimerMetricManyFieldValues(b *testing.B) {
+	defer resetTest()
+	values := make([]string, 400)
+	for i := range values {
+		values[i] = fmt.Sprintf("value%d", i)
+	}
+	bucketer := NewExponentialBucketer(12, 0, 1000, 4)
+	timer, err := NewTimerMetric("/timer", bucketer, "a timer metric", NewField("field", values))
+	if err != nil {
+		b.Fatalf("NewTimerMetric: %v", err)
+	}
+	last := values[len(values)-1]
+
+	b.Run("StartFinish", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			timer.Start(last).Finish()
+		}
+	})
+	b.Run("AddSampleByKey", func(b *testing.B) {
+		key := timer.FieldKey(last)
+		for i := 0; i < b.N; i++ {
+			start := CheapNowNano()
+			timer.AddSampleByKey(CheapNowNano()-start, key)
+		}
+	})
+}
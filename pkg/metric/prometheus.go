@@ -0,0 +1,277 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "gvisor.dev/gvisor/pkg/metric/metric_go_proto"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// PrometheusExporter writes snapshots of all registered metrics in the
+// Prometheus text exposition format.
+//
+// Everything about the output other than metric values is rendered once, the
+// first time the exporter is used, so that exporting a snapshot doesn't
+// allocate beyond growing the exporter's reusable output buffer. Distribution
+// metrics are exported as histograms without a sum, since only bucket counts
+// are recorded.
+type PrometheusExporter struct {
+	// prefix and labels are immutable.
+	prefix string
+	labels string
+
+	// mu serializes exports and protects the fields below.
+	mu sync.Mutex
+
+	// metrics is the sorted list of metrics to export. It is nil until the
+	// first export.
+	metrics []promMetric
+
+	// buf holds the output of the last export.
+	buf []byte
+
+	// samples holds a snapshot of a single distribution.
+	samples []uint64
+}
+
+// promMetric is a metric as exported by PrometheusExporter.
+type promMetric struct {
+	// name is the Prometheus name of the metric.
+	name string
+
+	// header holds the HELP and TYPE lines of the metric.
+	header string
+
+	// Exactly one of value and distribution is set.
+	value        func(fieldValues ...string) uint64
+	distribution *DistributionMetric
+
+	// series holds one element per combination of field values.
+	series []promSeries
+}
+
+// promSeries is a single time series of a promMetric.
+type promSeries struct {
+	// fieldValues are the values passed to promMetric.value.
+	fieldValues []string
+
+	// prefix is the metric name and labels of a uint64 series, followed by a
+	// space.
+	prefix string
+
+	// key is the field key of a distribution series.
+	key int
+
+	// buckets holds the metric name and labels of each bucket of a
+	// distribution series, followed by a space.
+	buckets []string
+
+	// count is the metric name and labels of a distribution series' sample
+	// count, followed by a space.
+	count string
+}
+
+// NewPrometheusExporter returns an exporter that names metrics by prefixing
+// their names with prefix, after converting them to valid Prometheus names
+// (e.g. "/foo/bar" becomes prefix+"foo_bar"), and adds labels to every time
+// series.
+func NewPrometheusExporter(prefix string, labels map[string]string) *PrometheusExporter {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		writePromLabel(&sb, name, labels[name])
+	}
+	return &PrometheusExporter{
+		prefix: prefix,
+		labels: sb.String(),
+	}
+}
+
+// Export writes a snapshot of all metrics to w.
+//
+// Preconditions: All metrics are registered.
+func (e *PrometheusExporter) Export(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.metrics == nil {
+		e.init()
+	}
+
+	b := e.buf[:0]
+	for i := range e.metrics {
+		m := &e.metrics[i]
+		b = append(b, m.header...)
+		for j := range m.series {
+			s := &m.series[j]
+			if m.value != nil {
+				b = append(b, s.prefix...)
+				b = strconv.AppendUint(b, m.value(s.fieldValues...), 10)
+				b = append(b, '\n')
+				continue
+			}
+			// As in snapshotDistribution, there is no need to read the
+			// buckets consistently.
+			samples := m.distribution.samples[s.key]
+			e.samples = e.samples[:0]
+			var total uint64
+			for k := range samples {
+				v := samples[k].Load()
+				e.samples = append(e.samples, v)
+				total += v
+			}
+			if total == 0 {
+				continue
+			}
+			// Prometheus buckets are cumulative.
+			var cumulative uint64
+			for k, v := range e.samples {
+				cumulative += v
+				b = append(b, s.buckets[k]...)
+				b = strconv.AppendUint(b, cumulative, 10)
+				b = append(b, '\n')
+			}
+			b = append(b, s.count...)
+			b = strconv.AppendUint(b, total, 10)
+			b = append(b, '\n')
+		}
+	}
+	e.buf = b
+	_, err := w.Write(b)
+	return err
+}
+
+// init renders the static parts of the exporter's output.
+//
+// Preconditions: e.mu is locked.
+func (e *PrometheusExporter) init() {
+	e.metrics = make([]promMetric, 0, len(allMetrics.uint64Metrics)+len(allMetrics.distributionMetrics))
+	for _, m := range allMetrics.uint64Metrics {
+		name := e.promName(m.metadata.GetName())
+		typ := "gauge"
+		if m.metadata.GetCumulative() {
+			typ = "counter"
+		}
+		pm := promMetric{
+			name:   name,
+			header: promHeader(name, m.metadata.GetDescription(), typ),
+			value:  m.value,
+		}
+		fields := m.metadata.GetFields()
+		if len(fields) == 0 {
+			pm.series = []promSeries{{prefix: name + e.promLabels(nil, nil, "") + " "}}
+		} else {
+			for _, v := range fields[0].GetAllowedValues() {
+				fieldValues := []string{v}
+				pm.series = append(pm.series, promSeries{
+					fieldValues: fieldValues,
+					prefix:      name + e.promLabels(fields, fieldValues, "") + " ",
+				})
+			}
+		}
+		e.metrics = append(e.metrics, pm)
+	}
+	for _, m := range allMetrics.distributionMetrics {
+		name := e.promName(m.metadata.GetName())
+		pm := promMetric{
+			name:         name,
+			header:       promHeader(name, m.metadata.GetDescription(), "histogram"),
+			distribution: m,
+		}
+		// Bucket i (where bucket 0 is the underflow bucket) holds samples
+		// below lowerBounds[i].
+		lowerBounds := m.metadata.GetDistributionBucketLowerBounds()
+		fields := m.metadata.GetFields()
+		for key := range m.samples {
+			fieldValues := m.fieldsToKey.keyToMultiField(key)
+			s := promSeries{
+				key:   key,
+				count: name + "_count" + e.promLabels(fields, fieldValues, "") + " ",
+			}
+			for i := range m.samples[key] {
+				le := "+Inf"
+				if i < len(lowerBounds) {
+					le = strconv.FormatInt(lowerBounds[i], 10)
+				}
+				s.buckets = append(s.buckets, name+"_bucket"+e.promLabels(fields, fieldValues, le)+" ")
+			}
+			pm.series = append(pm.series, s)
+		}
+		e.metrics = append(e.metrics, pm)
+	}
+	sort.Slice(e.metrics, func(i, j int) bool {
+		return e.metrics[i].name < e.metrics[j].name
+	})
+}
+
+// promName converts the metric name name to a Prometheus metric name.
+func (e *PrometheusExporter) promName(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	return e.prefix + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// promLabels returns the label set of a time series with the given fields,
+// including the exporter's labels and, if it is not empty, the bucket bound
+// le.
+func (e *PrometheusExporter) promLabels(fields []*pb.MetricMetadata_Field, fieldValues []string, le string) string {
+	var sb strings.Builder
+	sb.WriteString(e.labels)
+	for i, f := range fields {
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+		writePromLabel(&sb, f.GetFieldName(), fieldValues[i])
+	}
+	if le != "" {
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+		writePromLabel(&sb, "le", le)
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "{" + sb.String() + "}"
+}
+
+// promHeader returns the HELP and TYPE lines of a metric.
+func promHeader(name, description, typ string) string {
+	description = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(description)
+	return "# HELP " + name + " " + description + "\n# TYPE " + name + " " + typ + "\n"
+}
+
+// writePromLabel writes name="value" to sb, escaping value.
+func writePromLabel(sb *strings.Builder, name, value string) {
+	sb.WriteString(name)
+	sb.WriteString(`="`)
+	sb.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value))
+	sb.WriteByte('"')
+}
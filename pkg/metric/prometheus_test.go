@@ -0,0 +1,76 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"bytes"
+	"testing"
+
+	pb "gvisor.dev/gvisor/pkg/metric/metric_go_proto"
+)
+
+func TestPrometheusExport(t *testing.T) {
+	defer resetTest()
+
+	foo, err := NewUint64Metric("/foo", false, pb.MetricMetadata_UNITS_NONE, fooDescription)
+	if err != nil {
+		t.Fatalf("NewUint64Metric got err %v want nil", err)
+	}
+	bar, err := NewUint64Metric("/bar/baz", false, pb.MetricMetadata_UNITS_NONE, barDescription, NewField("weirdness_type", []string{"a", "b"}))
+	if err != nil {
+		t.Fatalf("NewUint64Metric got err %v want nil", err)
+	}
+	bucketer := NewExponentialBucketer(2, 10, 0, 1)
+	distrib, err := NewDistributionMetric("/distrib", false, bucketer, pb.MetricMetadata_UNITS_NONE, distribDescription, NewField("field1", []string{"x", "y"}))
+	if err != nil {
+		t.Fatalf("NewDistributionMetric got err %v want nil", err)
+	}
+	if err := Initialize(); err != nil {
+		t.Fatalf("Initialize(): %s", err)
+	}
+
+	foo.IncrementBy(3)
+	bar.Increment("b")
+	distrib.AddSample(5, "x")
+	distrib.AddSample(15, "x")
+	distrib.AddSample(1000, "x")
+
+	e := NewPrometheusExporter("runsc_", map[string]string{"container_id": "abc"})
+	want := `# HELP runsc_bar_baz Bar Baz
+# TYPE runsc_bar_baz counter
+runsc_bar_baz{container_id="abc",weirdness_type="a"} 0
+runsc_bar_baz{container_id="abc",weirdness_type="b"} 1
+# HELP runsc_distrib A distribution metric for testing
+# TYPE runsc_distrib histogram
+runsc_distrib_bucket{container_id="abc",field1="x",le="0"} 0
+runsc_distrib_bucket{container_id="abc",field1="x",le="10"} 1
+runsc_distrib_bucket{container_id="abc",field1="x",le="20"} 2
+runsc_distrib_bucket{container_id="abc",field1="x",le="+Inf"} 3
+runsc_distrib_count{container_id="abc",field1="x"} 3
+# HELP runsc_foo Foo!
+# TYPE runsc_foo counter
+runsc_foo{container_id="abc"} 3
+`
+	// Export twice to check that rendering is stable across snapshots.
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if err := e.Export(&buf); err != nil {
+			t.Fatalf("Export(): %v", err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("Export() got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
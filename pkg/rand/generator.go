@@ -0,0 +1,115 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rand
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"time"
+)
+
+const (
+	// generatorReseedInterval is the maximum time that a Generator uses a
+	// seed for, as for the Linux CRNG (CRNG_RESEED_INTERVAL).
+	generatorReseedInterval = 60 * time.Second
+
+	// generatorReseedBytes is the maximum number of bytes that a Generator
+	// outputs from one seed.
+	generatorReseedBytes = 1 << 30
+
+	// generatorBufSize is the number of bytes that a Generator buffers to
+	// serve small reads.
+	generatorBufSize = 256
+)
+
+// generatorIV is the counter that Generator starts each keystream at. Since
+// every keystream uses a new key, it never needs to vary.
+var generatorIV [aes.BlockSize]byte
+
+// Generator is a cryptographically secure pseudorandom number generator that
+// produces output from an AES-CTR keystream, seeded from Reader and reseeded
+// every generatorReseedInterval and generatorReseedBytes.
+//
+// Output is generated with the "fast key erasure" construction: each
+// keystream first produces the key for the next one, and the key in use is
+// overwritten immediately, so previous output can't be recovered from the
+// state of the Generator. Buffered output is erased as it is returned.
+//
+// The zero value is a Generator that is seeded on first use. Generator is
+// not thread-safe.
+type Generator struct {
+	// key is the key of the next keystream. It is valid if seededAt is not
+	// zero.
+	key [32]byte
+
+	// buf[len(buf)-avail:] is unused output.
+	buf   [generatorBufSize]byte
+	avail int
+
+	// seededAt is when the Generator was last seeded.
+	seededAt time.Time
+
+	// generated is the number of bytes produced since seededAt.
+	generated uint64
+}
+
+// Reseed causes g to be seeded again from Reader before producing more
+// output than what it has already buffered.
+func (g *Generator) Reseed() {
+	g.seededAt = time.Time{}
+}
+
+// Read implements io.Reader.Read. It only fails if g needs to be seeded and
+// Reader fails.
+func (g *Generator) Read(p []byte) (int, error) {
+	start := len(g.buf) - g.avail
+	n := copy(p, g.buf[start:])
+	zero(g.buf[start : start+n])
+	g.avail -= n
+	if n == len(p) {
+		return n, nil
+	}
+
+	if g.seededAt.IsZero() || time.Since(g.seededAt) >= generatorReseedInterval || g.generated >= generatorReseedBytes {
+		if _, err := io.ReadFull(Reader, g.key[:]); err != nil {
+			return n, err
+		}
+		g.seededAt = time.Now()
+		g.generated = 0
+	}
+	block, err := aes.NewCipher(g.key[:])
+	if err != nil {
+		// Unreachable: the key size is always valid.
+		panic(err)
+	}
+	stream := cipher.NewCTR(block, generatorIV[:])
+	// Replace the key before using the keystream for anything else.
+	zero(g.key[:])
+	stream.XORKeyStream(g.key[:], g.key[:])
+	rest := p[n:]
+	zero(rest)
+	stream.XORKeyStream(rest, rest)
+	stream.XORKeyStream(g.buf[:], g.buf[:])
+	g.avail = len(g.buf)
+	g.generated += uint64(len(rest) + len(g.buf))
+	return len(p), nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
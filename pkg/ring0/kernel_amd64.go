@@ -201,6 +201,9 @@ func (c *CPU) CR4() uint64 {
 	if hasFSGSBASE {
 		cr4 |= _CR4_FSGSBASE
 	}
+	if tscTrapping {
+		cr4 |= _CR4_TSD
+	}
 	return cr4
 }
 
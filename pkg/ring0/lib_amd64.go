@@ -76,6 +76,17 @@ var (
 	localXCR0     uintptr
 )
 
+// tscTrapping is set by EnableTSCTrapping.
+var tscTrapping bool
+
+// EnableTSCTrapping makes RDTSC and RDTSCP raise a general protection fault in
+// user mode, by setting CR4.TSD.
+//
+// This must be called prior to Init.
+func EnableTSCTrapping() {
+	tscTrapping = true
+}
+
 // Init sets function pointers based on architectural features.
 //
 // This must be called prior to using ring0. By default, it will be called by
@@ -25,6 +25,7 @@ const (
 	_CR0_AM = 1 << 18
 	_CR0_PG = 1 << 31
 
+	_CR4_TSD        = 1 << 2
 	_CR4_PSE        = 1 << 4
 	_CR4_PAE        = 1 << 5
 	_CR4_PGE        = 1 << 7
@@ -0,0 +1,363 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// CopyEntryPath returns the path, relative to the directory that a tar stream
+// is extracted to, of the entry called name. If top is not empty, it replaces
+// the first component of name; this is how a file or directory is copied to a
+// destination with a different name. CopyEntryPath returns an error if name
+// would not be within the directory.
+func CopyEntryPath(name, top string) (string, error) {
+	p := path.Clean(name)
+	if path.IsAbs(p) || p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("invalid tar entry name %q", name)
+	}
+	if top != "" {
+		if i := strings.IndexByte(p, '/'); i >= 0 {
+			p = top + p[i:]
+		} else {
+			p = top
+		}
+	}
+	return p, nil
+}
+
+// copier copies files in and out of a mount namespace on behalf of CopyIn and
+// CopyOut.
+type copier struct {
+	ctx   context.Context
+	creds *auth.Credentials
+	root  vfs.VirtualDentry
+	vfs   *vfs.VirtualFilesystem
+}
+
+func (c *copier) pop(p string, follow bool) *vfs.PathOperation {
+	return &vfs.PathOperation{
+		Root:               c.root,
+		Start:              c.root,
+		Path:               fspath.Parse(p),
+		FollowFinalSymlink: follow,
+	}
+}
+
+func (c *copier) stat(p string, follow bool) (linux.Statx, error) {
+	return c.vfs.StatAt(c.ctx, c.creds, c.pop(p, follow), &vfs.StatOptions{Mask: linux.STATX_BASIC_STATS})
+}
+
+// fdWriter provides an io.Writer interface for a vfs.FileDescription.
+type fdWriter struct {
+	ctx context.Context
+	fd  *vfs.FileDescription
+}
+
+// Write implements io.Writer.Write.
+func (f *fdWriter) Write(p []byte) (int, error) {
+	n, err := f.fd.Write(f.ctx, usermem.BytesIOSequence(p), vfs.WriteOptions{})
+	return int(n), err
+}
+
+// CopyOut writes the file or directory at src, resolved relative to root, to w
+// as a tar stream, with the credentials creds. Directories are copied
+// recursively, and symbolic links are copied as such. Entries are named
+// relative to the parent directory of src. File modes, timestamps, and
+// ownership as seen in creds' user namespace are preserved; file types other
+// than regular files, directories and symbolic links are skipped.
+func CopyOut(ctx context.Context, creds *auth.Credentials, root vfs.VirtualDentry, src string, w io.Writer) error {
+	name := path.Base(path.Clean(src))
+	if name == "/" || name == "." {
+		return fmt.Errorf("can't copy %q, copy the files it contains instead", src)
+	}
+	c := copier{
+		ctx:   ctx,
+		creds: creds,
+		root:  root,
+		vfs:   root.Mount().Filesystem().VirtualFilesystem(),
+	}
+	tw := tar.NewWriter(w)
+	if err := c.copyOut(tw, src, name); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (c *copier) copyOut(tw *tar.Writer, p, name string) error {
+	stat, err := c.stat(p, false /* follow */)
+	if err != nil {
+		return fmt.Errorf("stat %q: %w", p, err)
+	}
+	userns := c.creds.UserNamespace
+	hdr := &tar.Header{
+		Name:       name,
+		Mode:       int64(stat.Mode &^ linux.S_IFMT),
+		Uid:        int(userns.MapFromKUID(auth.KUID(stat.UID)).OrOverflow()),
+		Gid:        int(userns.MapFromKGID(auth.KGID(stat.GID)).OrOverflow()),
+		ModTime:    time.Unix(stat.Mtime.Sec, int64(stat.Mtime.Nsec)),
+		AccessTime: time.Unix(stat.Atime.Sec, int64(stat.Atime.Nsec)),
+		Format:     tar.FormatPAX,
+	}
+	switch stat.Mode & linux.S_IFMT {
+	case linux.S_IFREG:
+		fd, err := c.vfs.OpenAt(c.ctx, c.creds, c.pop(p, false /* follow */), &vfs.OpenOptions{
+			Flags: linux.O_RDONLY | linux.O_NOFOLLOW,
+		})
+		if err != nil {
+			return fmt.Errorf("open %q: %w", p, err)
+		}
+		defer fd.DecRef(c.ctx)
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(stat.Size)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		// The file may be truncated concurrently; only its size at the time
+		// of the stat can be copied.
+		if _, err := io.CopyN(tw, &fdReader{ctx: c.ctx, fd: fd}, hdr.Size); err != nil {
+			return fmt.Errorf("read %q: %w", p, err)
+		}
+		return nil
+
+	case linux.S_IFLNK:
+		target, err := c.vfs.ReadlinkAt(c.ctx, c.creds, c.pop(p, false /* follow */))
+		if err != nil {
+			return fmt.Errorf("readlink %q: %w", p, err)
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target
+		return tw.WriteHeader(hdr)
+
+	case linux.S_IFDIR:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		children, err := c.readDir(p)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := c.copyOut(tw, path.Join(p, child), path.Join(name, child)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		log.Warningf("Not copying %q: unsupported file type %#o", p, stat.Mode&linux.S_IFMT)
+		return nil
+	}
+}
+
+// readDir returns the sorted names of the entries of the directory at p.
+func (c *copier) readDir(p string) ([]string, error) {
+	fd, err := c.vfs.OpenAt(c.ctx, c.creds, c.pop(p, false /* follow */), &vfs.OpenOptions{
+		Flags: linux.O_RDONLY | linux.O_DIRECTORY | linux.O_NOFOLLOW,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", p, err)
+	}
+	defer fd.DecRef(c.ctx)
+	var names []string
+	if err := fd.IterDirents(c.ctx, vfs.IterDirentsCallbackFunc(func(dirent vfs.Dirent) error {
+		if dirent.Name != "." && dirent.Name != ".." {
+			names = append(names, dirent.Name)
+		}
+		return nil
+	})); err != nil {
+		return nil, fmt.Errorf("read directory %q: %w", p, err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CopyIn extracts the tar stream r, in the format written by CopyOut, to dst,
+// resolved relative to root, with the credentials creds. If dst is an existing
+// directory, the stream's top-level file or directory is created in it;
+// otherwise, it is created as dst. Existing files are overwritten. Ownership is
+// interpreted in creds' user namespace, and only preserved to the extent that
+// creds allow.
+//
+// If the destination is on a read-only mount, CopyIn fails with EROFS
+// without reading from r.
+func CopyIn(ctx context.Context, creds *auth.Credentials, root vfs.VirtualDentry, dst string, r io.Reader) error {
+	c := copier{
+		ctx:   ctx,
+		creds: creds,
+		root:  root,
+		vfs:   root.Mount().Filesystem().VirtualFilesystem(),
+	}
+	dir, top := dst, ""
+	if stat, err := c.stat(dst, true /* follow */); err != nil || stat.Mode&linux.S_IFMT != linux.S_IFDIR {
+		if err != nil && !linuxerr.Equals(linuxerr.ENOENT, err) {
+			return fmt.Errorf("stat %q: %w", dst, err)
+		}
+		dir, top = path.Dir(dst), path.Base(dst)
+	}
+
+	vd, err := c.vfs.GetDentryAt(ctx, creds, c.pop(dir, true /* follow */), &vfs.GetDentryOptions{CheckSearchable: true})
+	if err != nil {
+		return fmt.Errorf("resolve %q: %w", dir, err)
+	}
+	err = vd.Mount().CheckBeginWrite()
+	if err == nil {
+		vd.Mount().EndWrite()
+	}
+	vd.DecRef(ctx)
+	if err != nil {
+		return fmt.Errorf("write to %q: %w", dir, err)
+	}
+
+	// Directory metadata is applied once all entries have been extracted,
+	// since creating entries changes the timestamps of their directory.
+	type dirMetadata struct {
+		path string
+		hdr  *tar.Header
+	}
+	var dirs []dirMetadata
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar stream: %w", err)
+		}
+		rel, err := CopyEntryPath(hdr.Name, top)
+		if err != nil {
+			return err
+		}
+		p := path.Join(dir, rel)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := c.vfs.MkdirAt(ctx, creds, c.pop(p, false /* follow */), &vfs.MkdirOptions{Mode: 0700}); err != nil {
+				if stat, serr := c.stat(p, false /* follow */); !linuxerr.Equals(linuxerr.EEXIST, err) || serr != nil || stat.Mode&linux.S_IFMT != linux.S_IFDIR {
+					return fmt.Errorf("mkdir %q: %w", p, err)
+				}
+			}
+			dirs = append(dirs, dirMetadata{path: p, hdr: hdr})
+			continue
+
+		case tar.TypeReg:
+			if err := c.copyInFile(p, tr); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			err := c.vfs.SymlinkAt(ctx, creds, c.pop(p, false /* follow */), hdr.Linkname)
+			if linuxerr.Equals(linuxerr.EEXIST, err) {
+				if err = c.vfs.UnlinkAt(ctx, creds, c.pop(p, false /* follow */)); err == nil {
+					err = c.vfs.SymlinkAt(ctx, creds, c.pop(p, false /* follow */), hdr.Linkname)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("symlink %q: %w", p, err)
+			}
+
+		default:
+			log.Warningf("Not copying %q: unsupported tar entry type %q", p, hdr.Typeflag)
+			continue
+		}
+		if err := c.setMetadata(p, hdr); err != nil {
+			return err
+		}
+	}
+	// Apply metadata to children before their parents.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := c.setMetadata(dirs[i].path, dirs[i].hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyInFile creates or truncates the regular file at p and copies the contents
+// of r to it.
+func (c *copier) copyInFile(p string, r io.Reader) error {
+	fd, err := c.vfs.OpenAt(c.ctx, c.creds, c.pop(p, false /* follow */), &vfs.OpenOptions{
+		Flags: linux.O_WRONLY | linux.O_CREAT | linux.O_TRUNC | linux.O_NOFOLLOW,
+		Mode:  0600,
+	})
+	if err != nil {
+		return fmt.Errorf("open %q: %w", p, err)
+	}
+	defer fd.DecRef(c.ctx)
+	if _, err := io.Copy(&fdWriter{ctx: c.ctx, fd: fd}, r); err != nil {
+		return fmt.Errorf("write %q: %w", p, err)
+	}
+	return nil
+}
+
+// setMetadata applies the ownership, mode and timestamps in hdr to the file at
+// p without following symbolic links.
+func (c *copier) setMetadata(p string, hdr *tar.Header) error {
+	// Ownership is best effort: like tar(1) run by an unprivileged user, files
+	// are left owned by creds if they can't be chowned. It is changed first
+	// since chown clears the setuid and setgid bits.
+	userns := c.creds.UserNamespace
+	kuid := userns.MapToKUID(auth.UID(hdr.Uid))
+	kgid := userns.MapToKGID(auth.GID(hdr.Gid))
+	if kuid.Ok() && kgid.Ok() {
+		err := c.vfs.SetStatAt(c.ctx, c.creds, c.pop(p, false /* follow */), &vfs.SetStatOptions{
+			Stat: linux.Statx{
+				Mask: linux.STATX_UID | linux.STATX_GID,
+				UID:  uint32(kuid),
+				GID:  uint32(kgid),
+			},
+		})
+		if err != nil && !linuxerr.Equals(linuxerr.EPERM, err) {
+			return fmt.Errorf("chown %q: %w", p, err)
+		}
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		// Symbolic links have no mode, and their timestamps are not
+		// meaningful.
+		return nil
+	}
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+	if err := c.vfs.SetStatAt(c.ctx, c.creds, c.pop(p, false /* follow */), &vfs.SetStatOptions{
+		Stat: linux.Statx{
+			Mask:  linux.STATX_MODE | linux.STATX_ATIME | linux.STATX_MTIME,
+			Mode:  uint16(hdr.Mode) &^ linux.S_IFMT,
+			Atime: linux.NsecToStatxTimestamp(atime.UnixNano()),
+			Mtime: linux.NsecToStatxTimestamp(hdr.ModTime.UnixNano()),
+		},
+	}); err != nil {
+		return fmt.Errorf("setting attributes of %q: %w", p, err)
+	}
+	return nil
+}
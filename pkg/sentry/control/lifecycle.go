@@ -215,17 +215,16 @@ func (l *Lifecycle) StartContainer(args *StartContainerArgs, _ *uint32) error {
 		Filename: args.Filename,
 		Argv:     args.Argv,
 		// Order Envv before SecretEnvv.
-		Envv:                    append(args.Envv, args.SecretEnvv...),
-		WorkingDirectory:        args.WorkingDirectory,
-		Credentials:             creds,
-		Umask:                   0022,
-		Limits:                  ls,
-		MaxSymlinkTraversals:    linux.MaxSymlinkTraversals,
-		UTSNamespace:            l.Kernel.RootUTSNamespace(),
-		IPCNamespace:            l.Kernel.RootIPCNamespace(),
-		AbstractSocketNamespace: l.Kernel.RootAbstractSocketNamespace(),
-		ContainerID:             args.ContainerID,
-		PIDNamespace:            pidNs,
+		Envv:                 append(args.Envv, args.SecretEnvv...),
+		WorkingDirectory:     args.WorkingDirectory,
+		Credentials:          creds,
+		Umask:                0022,
+		Limits:               ls,
+		MaxSymlinkTraversals: linux.MaxSymlinkTraversals,
+		UTSNamespace:         l.Kernel.RootUTSNamespace(),
+		IPCNamespace:         l.Kernel.RootIPCNamespace(),
+		ContainerID:          args.ContainerID,
+		PIDNamespace:         pidNs,
 	}
 
 	ctx := initArgs.NewContext(l.Kernel)
@@ -334,15 +333,25 @@ func (l *Lifecycle) reap(containerID string, tg *kernel.ThreadGroup) {
 	})
 }
 
-// Pause pauses all tasks, blocking until they are stopped.
-func (l *Lifecycle) Pause(_, _ *struct{}) error {
-	l.Kernel.Pause()
+// Pause pauses all tasks in the given container, or all tasks if no container
+// is specified, blocking until they are stopped.
+func (l *Lifecycle) Pause(args *ContainerArgs, _ *struct{}) error {
+	if args == nil || args.ContainerID == "" {
+		l.Kernel.Pause()
+		return nil
+	}
+	l.Kernel.PauseContainer(args.ContainerID)
 	return nil
 }
 
-// Resume resumes all tasks.
-func (l *Lifecycle) Resume(_, _ *struct{}) error {
-	l.Kernel.Unpause()
+// Resume resumes all tasks in the given container, or all tasks if no
+// container is specified.
+func (l *Lifecycle) Resume(args *ContainerArgs, _ *struct{}) error {
+	if args == nil || args.ContainerID == "" {
+		l.Kernel.Unpause()
+		return nil
+	}
+	l.Kernel.UnpauseContainer(args.ContainerID)
 	return nil
 }
 
@@ -15,11 +15,14 @@
 package control
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/strace"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
+	"gvisor.dev/gvisor/pkg/urpc"
 )
 
 // LoggingArgs are the arguments to use for changing the logging
@@ -33,6 +36,15 @@ type LoggingArgs struct {
 	// Level is the log level that will be set if SetLevel is true.
 	Level log.Level
 
+	// SetSubsystems indicates that we should update the subsystems that
+	// debug and info statements are logged for.
+	SetSubsystems bool
+
+	// Subsystems are the names of the subsystems to log debug and info
+	// statements for if SetSubsystems is true. If empty, all subsystems
+	// are logged.
+	Subsystems []string
+
 	// SetLogPackets indicates that we should update the log packets flag.
 	SetLogPackets bool
 
@@ -66,7 +78,10 @@ type LoggingArgs struct {
 }
 
 // Logging provides functions related to logging.
-type Logging struct{}
+type Logging struct {
+	// Ring, if not nil, retains recent log statements for Dump and Follow.
+	Ring *log.RingEmitter
+}
 
 // Change will change the log level and strace arguments. Although
 // this functions signature requires an error it never actually
@@ -80,6 +95,19 @@ func (l *Logging) Change(args *LoggingArgs, code *int) error {
 		log.SetLevel(args.Level)
 	}
 
+	if args.SetSubsystems {
+		subsystems := make([]log.Subsystem, 0, len(args.Subsystems))
+		for _, name := range args.Subsystems {
+			s, err := log.ParseSubsystem(name)
+			if err != nil {
+				return err
+			}
+			subsystems = append(subsystems, s)
+		}
+		log.SetSubsystems(subsystems)
+		log.Infof("Log subsystems set to: %v", args.Subsystems)
+	}
+
 	if args.SetLogPackets {
 		if args.LogPackets {
 			sniffer.LogPackets.Store(1)
@@ -133,3 +161,72 @@ func (l *Logging) configureEventStrace(args *LoggingArgs) error {
 	}
 	return nil
 }
+
+// LogsArgs are the arguments to Dump and Follow.
+type LogsArgs struct {
+	// FilePayload contains the file that log statements are written to.
+	urpc.FilePayload
+}
+
+// errNoRing is returned by Dump and Follow if recent log statements aren't
+// retained.
+var errNoRing = errors.New("log ring buffer is disabled")
+
+// Dump writes the log statements retained by the ring buffer, oldest first,
+// to the donated file.
+func (l *Logging) Dump(args *LogsArgs, _ *struct{}) error {
+	if len(args.Files) != 1 {
+		return fmt.Errorf("Dump requires exactly one output file, got %d", len(args.Files))
+	}
+	out := args.Files[0]
+	defer out.Close()
+	if l.Ring == nil {
+		return errNoRing
+	}
+	entries, _, _ := l.Ring.Read(0)
+	_, err := out.Write(formatEntries(entries))
+	return err
+}
+
+// Follow writes log statements to the donated file as they are emitted,
+// until writing to the file fails, e.g. because the reader at the other end
+// of a pipe went away.
+//
+// Follow doesn't log anything itself, since that would feed back into the
+// statements it writes.
+func (l *Logging) Follow(args *LogsArgs, _ *struct{}) error {
+	if len(args.Files) != 1 {
+		return fmt.Errorf("Follow requires exactly one output file, got %d", len(args.Files))
+	}
+	out := args.Files[0]
+	defer out.Close()
+	if l.Ring == nil {
+		return errNoRing
+	}
+	from := l.Ring.End()
+	for {
+		entries, next, wait := l.Ring.Read(from)
+		if len(entries) == 0 {
+			<-wait
+			continue
+		}
+		buf := formatEntries(entries)
+		if dropped := next - uint64(len(entries)) - from; dropped > 0 {
+			buf = append([]byte(fmt.Sprintf("*** Dropped %d log messages ***\n", dropped)), buf...)
+		}
+		if _, err := out.Write(buf); err != nil {
+			return nil
+		}
+		from = next
+	}
+}
+
+// formatEntries formats entries one per line.
+func formatEntries(entries []log.Entry) []byte {
+	var buf bytes.Buffer
+	for i := range entries {
+		buf.WriteString(entries[i].String())
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
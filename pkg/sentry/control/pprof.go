@@ -15,6 +15,7 @@
 package control
 
 import (
+	"fmt"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
@@ -43,6 +44,13 @@ const (
 	DefaultMutexProfileRate = 10
 )
 
+// errProfileInProgress returns the error returned when a profile of the given
+// kind is requested while another one is still being collected. Profiles of
+// different kinds may be collected concurrently.
+func errProfileInProgress(kind string) error {
+	return fmt.Errorf("a %s profile is already being collected", kind)
+}
+
 // Profile includes profile-related RPC stubs. It provides a way to
 // control the built-in runtime profiling facilities.
 //
@@ -51,7 +59,8 @@ type Profile struct {
 	// kernel is the kernel under profile. It's immutable.
 	kernel *kernel.Kernel
 
-	// cpuMu protects CPU profiling.
+	// cpuMu protects CPU profiling. Like the mutexes below, it is held for
+	// the duration of the profile.
 	cpuMu sync.Mutex
 
 	// blockMu protects block profiling.
@@ -98,7 +107,9 @@ func (p *Profile) CPU(o *CPUProfileOpts, _ *struct{}) error {
 	output := o.FilePayload.Files[0]
 	defer output.Close()
 
-	p.cpuMu.Lock()
+	if !p.cpuMu.TryLock() {
+		return errProfileInProgress("CPU")
+	}
 	defer p.cpuMu.Unlock()
 
 	// Returns an error if profiling is already started.
@@ -188,7 +199,9 @@ func (p *Profile) Block(o *BlockProfileOpts, _ *struct{}) error {
 	output := o.FilePayload.Files[0]
 	defer output.Close()
 
-	p.blockMu.Lock()
+	if !p.blockMu.TryLock() {
+		return errProfileInProgress("block")
+	}
 	defer p.blockMu.Unlock()
 
 	// Always set the rate. We then wait to collect a profile at this rate,
@@ -230,7 +243,9 @@ func (p *Profile) Mutex(o *MutexProfileOpts, _ *struct{}) error {
 	output := o.FilePayload.Files[0]
 	defer output.Close()
 
-	p.mutexMu.Lock()
+	if !p.mutexMu.TryLock() {
+		return errProfileInProgress("mutex")
+	}
 	defer p.mutexMu.Unlock()
 
 	// Always set the fraction.
@@ -271,7 +286,9 @@ func (p *Profile) Trace(o *TraceProfileOpts, _ *struct{}) error {
 	}
 	defer output.Close()
 
-	p.traceMu.Lock()
+	if !p.traceMu.TryLock() {
+		return errProfileInProgress("trace")
+	}
 	defer p.traceMu.Unlock()
 
 	// Returns an error if profiling is already started.
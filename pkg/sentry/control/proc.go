@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
 	"gvisor.dev/gvisor/pkg/fd"
 	"gvisor.dev/gvisor/pkg/sentry/fdimport"
 	"gvisor.dev/gvisor/pkg/sentry/fs/user"
@@ -92,8 +93,28 @@ type ExecArgs struct {
 	// PIDNamespace is the pid namespace for the process being executed.
 	PIDNamespace *kernel.PIDNamespace
 
+	// TimeNamespace is the time namespace for the process being executed.
+	// If nil, the root time namespace is used.
+	TimeNamespace *kernel.TimeNamespace
+
 	// Limits is the limit set for the process being executed.
 	Limits *limits.LimitSet
+
+	// CPUs is the number of CPUs that the process and its descendants may
+	// use. If zero, their CPU usage is only limited by the container's.
+	CPUs float64 `json:"cpus"`
+
+	// MemoryLimit is the maximum resident set size in bytes of the process
+	// and its descendants combined. If it is exceeded, they are all killed.
+	// If zero, their memory usage is only limited by the container's.
+	MemoryLimit uint64 `json:"memory_limit"`
+
+	// SyscallFilters are seccomp filters to install on the process before it
+	// starts.
+	SyscallFilters []bpf.Program
+
+	// Personality is the personality of the process, as for personality(2).
+	Personality uint32
 }
 
 // String prints the arguments as a string.
@@ -150,22 +171,33 @@ func (proc *Proc) execAsync(args *ExecArgs) (*kernel.ThreadGroup, kernel.ThreadI
 	if limitSet == nil {
 		limitSet = limits.NewLimitSet()
 	}
+	var limitGroup *kernel.LimitGroup
+	if args.CPUs != 0 || args.MemoryLimit != 0 {
+		limitGroup = kernel.NewLimitGroup(args.CPUs, args.MemoryLimit)
+		if args.MemoryLimit != 0 {
+			// Report the limit as RLIMIT_RSS, which Linux doesn't enforce,
+			// so that it shows up in /proc/[pid]/limits.
+			limitSet.SetUnchecked(limits.Rss, limits.Limit{Cur: args.MemoryLimit, Max: args.MemoryLimit})
+		}
+	}
 	initArgs := kernel.CreateProcessArgs{
-		Filename:                args.Filename,
-		Argv:                    args.Argv,
-		Envv:                    args.Envv,
-		WorkingDirectory:        args.WorkingDirectory,
-		MountNamespace:          args.MountNamespace,
-		Credentials:             creds,
-		FDTable:                 fdTable,
-		Umask:                   0022,
-		Limits:                  limitSet,
-		MaxSymlinkTraversals:    linux.MaxSymlinkTraversals,
-		UTSNamespace:            proc.Kernel.RootUTSNamespace(),
-		IPCNamespace:            proc.Kernel.RootIPCNamespace(),
-		AbstractSocketNamespace: proc.Kernel.RootAbstractSocketNamespace(),
-		ContainerID:             args.ContainerID,
-		PIDNamespace:            pidns,
+		Filename:             args.Filename,
+		Argv:                 args.Argv,
+		Envv:                 args.Envv,
+		WorkingDirectory:     args.WorkingDirectory,
+		MountNamespace:       args.MountNamespace,
+		Credentials:          creds,
+		FDTable:              fdTable,
+		Umask:                0022,
+		Limits:               limitSet,
+		MaxSymlinkTraversals: linux.MaxSymlinkTraversals,
+		UTSNamespace:         proc.Kernel.RootUTSNamespace(),
+		IPCNamespace:         proc.Kernel.RootIPCNamespace(),
+		TimeNamespace:        args.TimeNamespace,
+		ContainerID:          args.ContainerID,
+		PIDNamespace:         pidns,
+		LimitGroup:           limitGroup,
+		Personality:          args.Personality,
 	}
 	if initArgs.MountNamespace != nil {
 		// initArgs must hold a reference on MountNamespaceVFS2, which will
@@ -217,6 +249,12 @@ func (proc *Proc) execAsync(args *ExecArgs) (*kernel.ThreadGroup, kernel.ThreadI
 		ttyFile.InitForegroundProcessGroup(tg.ProcessGroup())
 	}
 
+	for _, filter := range args.SyscallFilters {
+		if err := tg.Leader().AppendSyscallFilter(filter, true, nil); err != nil {
+			return nil, 0, nil, fmt.Errorf("appending seccomp filters: %w", err)
+		}
+	}
+
 	// Start the newly created process.
 	proc.Kernel.StartProcess(tg)
 
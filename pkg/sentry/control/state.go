@@ -27,7 +27,11 @@ import (
 
 // ErrInvalidFiles is returned when the urpc call to Save does not include an
 // appropriate file payload (e.g. there is no output file!).
-var ErrInvalidFiles = errors.New("exactly one file must be provided")
+var ErrInvalidFiles = errors.New("a state file and an optional pages file must be provided")
+
+// ErrInvalidMigrationFiles is returned when the urpc call to Migrate does not
+// include exactly one file, the connection to the destination.
+var ErrInvalidMigrationFiles = errors.New("a connection to the migration destination must be provided")
 
 // State includes state-related functions.
 type State struct {
@@ -40,27 +44,47 @@ type SaveOpts struct {
 	// Key is used for state integrity check.
 	Key []byte `json:"key"`
 
+	// EncryptionKey, if set, is used to encrypt and authenticate the state.
+	// See state.SaveOpts.EncryptionKey.
+	EncryptionKey []byte `json:"encryption_key"`
+
 	// Metadata is the set of metadata to prepend to the state file.
 	Metadata map[string]string `json:"metadata"`
 
-	// FilePayload contains the destination for the state.
+	// Resume indicates if the sandbox process should continue running
+	// after checkpointing.
+	Resume bool `json:"resume"`
+
+	// FilePayload contains the destination for the state, optionally
+	// followed by the destination for the contents of memory.
 	urpc.FilePayload
 }
 
 // Save saves the running system.
 func (s *State) Save(o *SaveOpts, _ *struct{}) error {
 	// Create an output stream.
-	if len(o.FilePayload.Files) != 1 {
+	if len(o.FilePayload.Files) != 1 && len(o.FilePayload.Files) != 2 {
 		return ErrInvalidFiles
 	}
-	defer o.FilePayload.Files[0].Close()
+	for _, f := range o.FilePayload.Files {
+		defer f.Close()
+	}
 
 	// Save to the first provided stream.
 	saveOpts := state.SaveOpts{
-		Destination: o.FilePayload.Files[0],
-		Key:         o.Key,
-		Metadata:    o.Metadata,
+		Destination:   o.FilePayload.Files[0],
+		Key:           o.Key,
+		EncryptionKey: o.EncryptionKey,
+		Metadata:      o.Metadata,
 		Callback: func(err error) {
+			if o.Resume {
+				if err == nil {
+					log.Infof("Save succeeded: resuming...")
+				} else {
+					log.Warningf("Save failed: resuming...")
+				}
+				return
+			}
 			if err == nil {
 				log.Infof("Save succeeded: exiting...")
 				s.Kernel.SetSaveSuccess(false /* autosave */)
@@ -71,5 +95,58 @@ func (s *State) Save(o *SaveOpts, _ *struct{}) error {
 			s.Kernel.Kill(linux.WaitStatusExit(0))
 		},
 	}
+	if len(o.FilePayload.Files) == 2 {
+		saveOpts.PagesFile = o.FilePayload.Files[1]
+	}
 	return saveOpts.Save(s.Kernel.SupervisorContext(), s.Kernel, s.Watchdog)
 }
+
+// MigrateOpts contains options for the Migrate RPC call.
+type MigrateOpts struct {
+	// Key is used for state integrity check.
+	Key []byte `json:"key"`
+
+	// Metadata is the set of metadata to prepend to the state file.
+	Metadata map[string]string `json:"metadata"`
+
+	// MaxRounds is the maximum number of pre-copy rounds.
+	MaxRounds int `json:"max_rounds"`
+
+	// DirtyThreshold ends pre-copy once a round copies at most this many
+	// bytes of memory.
+	DirtyThreshold uint64 `json:"dirty_threshold"`
+
+	// FilePayload contains the connection to the destination.
+	urpc.FilePayload
+}
+
+// Migrate migrates the running system to a destination accepting a live
+// migration, and exits once it is restored there. If migration fails, the
+// system resumes running.
+func (s *State) Migrate(o *MigrateOpts, stats *state.MigrationStats) error {
+	if len(o.FilePayload.Files) != 1 {
+		return ErrInvalidMigrationFiles
+	}
+	conn := o.FilePayload.Files[0]
+	defer conn.Close()
+
+	migrateOpts := state.MigrateOpts{
+		Conn:           conn,
+		Key:            o.Key,
+		Metadata:       o.Metadata,
+		MaxRounds:      o.MaxRounds,
+		DirtyThreshold: o.DirtyThreshold,
+		Callback: func(err error) {
+			if err != nil {
+				log.Warningf("Migration failed: resuming...")
+				return
+			}
+			log.Infof("Migration succeeded: exiting...")
+			s.Kernel.SetSaveSuccess(false /* autosave */)
+			s.Kernel.Kill(linux.WaitStatusExit(0))
+		},
+	}
+	var err error
+	*stats, err = migrateOpts.Migrate(s.Kernel.SupervisorContext(), s.Kernel, s.Watchdog)
+	return err
+}
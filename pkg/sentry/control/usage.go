@@ -23,6 +23,9 @@ import (
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/shrinker"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/urpc"
 )
@@ -137,6 +140,9 @@ type UsageReduceOutput struct{}
 
 // Reduce requests that the sentry attempt to reduce its memory usage.
 func (u *Usage) Reduce(opts *UsageReduceOpts, out *UsageReduceOutput) error {
+	// Drop discardable caches first, since that may make more memory
+	// evictable.
+	shrinker.Shrink(u.Kernel.SupervisorContext(), shrinker.TotalBytes())
 	mf := u.Kernel.MemoryFile()
 	mf.StartEvictions()
 	if opts.Wait {
@@ -145,6 +151,97 @@ func (u *Usage) Reduce(opts *UsageReduceOpts, out *UsageReduceOutput) error {
 	return nil
 }
 
+// MemoryBreakdownOpts contains options to Usage.MemoryBreakdown().
+type MemoryBreakdownOpts struct{}
+
+// GoRuntimeMemory contains memory statistics of the Go runtime, in bytes. See
+// runtime.MemStats for the meaning of each field.
+type GoRuntimeMemory struct {
+	Sys          uint64 `json:"Sys"`
+	HeapAlloc    uint64 `json:"HeapAlloc"`
+	HeapSys      uint64 `json:"HeapSys"`
+	HeapIdle     uint64 `json:"HeapIdle"`
+	HeapInuse    uint64 `json:"HeapInuse"`
+	HeapReleased uint64 `json:"HeapReleased"`
+	StackSys     uint64 `json:"StackSys"`
+}
+
+// MemoryBreakdown is a breakdown of the memory used by the sandbox.
+type MemoryBreakdown struct {
+	// Usage is the full accounting of application memory, as returned by
+	// Usage.Collect with MemoryUsageOpts.Full set.
+	Usage MemoryUsage `json:"Usage"`
+
+	// MemoryFile is the state of the MemoryFile backing application memory.
+	MemoryFile pgalloc.MemoryFileStats `json:"MemoryFile"`
+
+	// GoRuntime is the memory used by the sentry's Go runtime.
+	GoRuntime GoRuntimeMemory `json:"GoRuntime"`
+
+	// ContainerRSS maps each container ID to the resident set size of its
+	// processes in bytes. Memory shared between processes is counted once per
+	// address space.
+	ContainerRSS map[string]uint64 `json:"ContainerRSS"`
+
+	// Caches is the usage of discardable sentry caches, by kind of cache.
+	Caches []shrinker.CacheUsage `json:"Caches"`
+}
+
+// MemoryBreakdown returns a breakdown of the memory used by the sandbox.
+func (u *Usage) MemoryBreakdown(_ *MemoryBreakdownOpts, out *MemoryBreakdown) error {
+	mf := u.Kernel.MemoryFile()
+	if err := mf.UpdateUsage(); err != nil {
+		return err
+	}
+	snapshot, total := usage.MemoryAccounting.Copy()
+	*out = MemoryBreakdown{
+		Usage: MemoryUsage{
+			System:    snapshot.System,
+			Anonymous: snapshot.Anonymous,
+			PageCache: snapshot.PageCache,
+			Mapped:    snapshot.Mapped,
+			Tmpfs:     snapshot.Tmpfs,
+			Ramdiskfs: snapshot.Ramdiskfs,
+			Total:     total,
+		},
+		MemoryFile:   mf.Stats(),
+		ContainerRSS: make(map[string]uint64),
+		Caches:       shrinker.Usage(),
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	out.GoRuntime = GoRuntimeMemory{
+		Sys:          ms.Sys,
+		HeapAlloc:    ms.HeapAlloc,
+		HeapSys:      ms.HeapSys,
+		HeapIdle:     ms.HeapIdle,
+		HeapInuse:    ms.HeapInuse,
+		HeapReleased: ms.HeapReleased,
+		StackSys:     ms.StackSys,
+	}
+
+	seen := make(map[*mm.MemoryManager]struct{})
+	for _, tg := range u.Kernel.TaskSet().Root.ThreadGroups() {
+		leader := tg.Leader()
+		if leader == nil {
+			continue
+		}
+		leader.WithMuLocked(func(t *kernel.Task) {
+			m := t.MemoryManager()
+			if m == nil {
+				return
+			}
+			if _, ok := seen[m]; ok {
+				return
+			}
+			seen[m] = struct{}{}
+			out.ContainerRSS[t.ContainerID()] += m.ResidentSetSize()
+		})
+	}
+	return nil
+}
+
 // MemoryUsageRecord contains the mapping and platform memory file.
 type MemoryUsageRecord struct {
 	mmap  uintptr
@@ -15,10 +15,16 @@
 package memdev
 
 import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
-	"gvisor.dev/gvisor/pkg/rand"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
@@ -28,6 +34,10 @@ const (
 	urandomDevMinor = 9
 )
 
+// randomPoolBits is the size of the Linux input pool in bits (POOL_BITS),
+// which is the entropy count that it reports once it is initialized.
+const randomPoolBits = 256
+
 // randomDevice implements vfs.Device for /dev/random and /dev/urandom.
 //
 // +stateify savable
@@ -65,12 +75,12 @@ func (fd *randomFD) Release(context.Context) {
 
 // PRead implements vfs.FileDescriptionImpl.PRead.
 func (fd *randomFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
-	return dst.CopyOutFrom(ctx, safemem.FromIOReader{rand.Reader})
+	return dst.CopyOutFrom(ctx, safemem.FromIOReader{kernel.RandomFromContext(ctx)})
 }
 
 // Read implements vfs.FileDescriptionImpl.Read.
 func (fd *randomFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
-	n, err := dst.CopyOutFrom(ctx, safemem.FromIOReader{rand.Reader})
+	n, err := dst.CopyOutFrom(ctx, safemem.FromIOReader{kernel.RandomFromContext(ctx)})
 	fd.off.Add(n)
 	return n, err
 }
@@ -94,3 +104,81 @@ func (fd *randomFD) Seek(ctx context.Context, offset int64, whence int32) (int64
 	// == noop_llseek
 	return fd.off.Load(), nil
 }
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+//
+// The pool is always initialized in the sandbox, so, as in Linux 5.18 and
+// later, the entropy count is always randomPoolBits: crediting entropy can't
+// raise it, and reading doesn't lower it. Entropy added by RNDADDENTROPY is
+// discarded, like writes.
+func (fd *randomFD) Ioctl(ctx context.Context, uio usermem.IO, args arch.SyscallArguments) (uintptr, error) {
+	request := args[1].Uint()
+	data := args[2].Pointer()
+	cc := &usermem.IOCopyContext{
+		Ctx: ctx,
+		IO:  uio,
+		Opts: usermem.IOOpts{
+			AddressSpaceActive: true,
+		},
+	}
+
+	switch request {
+	case linux.RNDGETENTCNT:
+		cnt := primitive.Int32(randomPoolBits)
+		_, err := cnt.CopyOut(cc, data)
+		return 0, err
+	case linux.RNDADDTOENTCNT, linux.RNDADDENTROPY, linux.RNDZAPENTCNT, linux.RNDCLEARPOOL, linux.RNDRESEEDCRNG:
+		if creds := auth.CredentialsFromContext(ctx); !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, creds.UserNamespace.Root()) {
+			return 0, linuxerr.EPERM
+		}
+	default:
+		return 0, linuxerr.EINVAL
+	}
+
+	switch request {
+	case linux.RNDADDTOENTCNT:
+		var cnt primitive.Int32
+		if _, err := cnt.CopyIn(cc, data); err != nil {
+			return 0, err
+		}
+		if cnt < 0 {
+			return 0, linuxerr.EINVAL
+		}
+	case linux.RNDADDENTROPY:
+		// The argument is a struct rand_pool_info: the entropy count and the
+		// size of the buffer that follows it.
+		var cnt, size primitive.Int32
+		if _, err := cnt.CopyIn(cc, data); err != nil {
+			return 0, err
+		}
+		if cnt < 0 {
+			return 0, linuxerr.EINVAL
+		}
+		if _, err := size.CopyIn(cc, data+4); err != nil {
+			return 0, err
+		}
+		if size < 0 {
+			return 0, linuxerr.EFAULT
+		}
+		// The buffer must still be readable.
+		buf := make([]byte, hostarch.PageSize)
+		addr := data + 8
+		for rem := int(size); rem > 0; {
+			n := rem
+			if n > len(buf) {
+				n = len(buf)
+			}
+			if _, err := uio.CopyIn(ctx, addr, buf[:n], cc.Opts); err != nil {
+				return 0, linuxerr.EFAULT
+			}
+			addr += hostarch.Addr(n)
+			rem -= n
+		}
+	case linux.RNDRESEEDCRNG:
+		if t := kernel.TaskFromContext(ctx); t != nil {
+			t.Random().Reseed()
+		}
+	}
+	// RNDZAPENTCNT and RNDCLEARPOOL no longer have any effect in Linux.
+	return 0, nil
+}
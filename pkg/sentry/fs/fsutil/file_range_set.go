@@ -189,6 +189,76 @@ func (frs *FileRangeSet) Drop(mr memmap.MappableRange, mf *pgalloc.MemoryFile) {
 	}
 }
 
+// Punch updates frs to reflect deallocation of the memmap.Mappable offsets in
+// mr, as by fallocate(FALLOC_FL_PUNCH_HOLE): pages that lie entirely within mr
+// are freed, and bytes in mr on partially-covered pages are zeroed. It returns
+// the freed subset of mr, which is page-aligned and may be empty, and the
+// number of pages freed.
+func (frs *FileRangeSet) Punch(mr memmap.MappableRange, mf *pgalloc.MemoryFile) (memmap.MappableRange, uint64) {
+	var freed memmap.MappableRange
+	if pgstart, ok := hostarch.PageRoundUp(mr.Start); ok {
+		if pgend := hostarch.PageRoundDown(mr.End); pgstart < pgend {
+			freed = memmap.MappableRange{pgstart, pgend}
+		}
+	}
+	if freed.Length() == 0 {
+		frs.zero(mr, mf)
+		return freed, 0
+	}
+
+	frs.zero(memmap.MappableRange{mr.Start, freed.Start}, mf)
+	frs.zero(memmap.MappableRange{freed.End, mr.End}, mf)
+	var pagesFreed uint64
+	seg := frs.LowerBoundSegment(freed.Start)
+	for seg.Ok() && seg.Start() < freed.End {
+		seg = frs.Isolate(seg, freed)
+		mf.DecRef(seg.FileRange())
+		pagesFreed += seg.Range().Length() / hostarch.PageSize
+		seg = frs.Remove(seg).NextSegment()
+	}
+	return freed, pagesFreed
+}
+
+// zero zeroes the memory backing memmap.Mappable offsets in mr.
+func (frs *FileRangeSet) zero(mr memmap.MappableRange, mf *pgalloc.MemoryFile) {
+	if mr.Length() == 0 {
+		return
+	}
+	for seg := frs.LowerBoundSegment(mr.Start); seg.Ok() && seg.Start() < mr.End; seg = seg.NextSegment() {
+		fr := seg.FileRangeOf(seg.Range().Intersect(mr))
+		ims, err := mf.MapInternal(fr, hostarch.Write)
+		if err != nil {
+			// As in Truncate, the caller may have already deallocated mr
+			// in the backing file, so we can't leave cached memory
+			// inconsistent.
+			panic(fmt.Sprintf("Failed to map %v: %v", fr, err))
+		}
+		if _, err := safemem.ZeroSeq(ims); err != nil {
+			panic(fmt.Sprintf("Zeroing %v failed: %v", fr, err))
+		}
+	}
+}
+
+// ForEachRange calls fn, in order, with each maximal subrange of mr that has
+// segments in frs.
+func (frs *FileRangeSet) ForEachRange(mr memmap.MappableRange, fn func(memmap.MappableRange)) {
+	var cur memmap.MappableRange
+	for seg := frs.LowerBoundSegment(mr.Start); seg.Ok() && seg.Start() < mr.End; seg = seg.NextSegment() {
+		segMR := seg.Range().Intersect(mr)
+		if cur.Length() != 0 && cur.End == segMR.Start {
+			cur.End = segMR.End
+			continue
+		}
+		if cur.Length() != 0 {
+			fn(cur)
+		}
+		cur = segMR
+	}
+	if cur.Length() != 0 {
+		fn(cur)
+	}
+}
+
 // DropAll removes all segments in mr, freeing the corresponding
 // memmap.FileRanges. It returns the number of pages freed.
 func (frs *FileRangeSet) DropAll(mf *pgalloc.MemoryFile) uint64 {
@@ -247,6 +247,12 @@ func (c *ConnectedEndpoint) Writable() bool {
 	return fdnotifier.NonBlockingPoll(int32(c.file.FD()), waiter.WritableEvents)&waiter.WritableEvents != 0
 }
 
+// Credentials implements transport.ConnectedEndpoint.Credentials.
+func (c *ConnectedEndpoint) Credentials() transport.CredentialsControlMessage {
+	// Host peers have no identity in the sandbox.
+	return nil
+}
+
 // Passcred implements transport.ConnectedEndpoint.Passcred.
 func (c *ConnectedEndpoint) Passcred() bool {
 	// We don't support credential passing for host sockets.
@@ -40,6 +40,9 @@ type File interface {
 	// Type returns the file type, e.g. linux.S_IFREG.
 	Type(context.Context) (linux.FileMode, error)
 
+	// GetXattr returns the value of the given extended attribute of the file.
+	GetXattr(ctx context.Context, name string) (string, error)
+
 	// IncRef increments reference.
 	IncRef()
 
@@ -81,6 +81,11 @@ func (f *fsFile) Type(context.Context) (linux.FileMode, error) {
 	return linux.FileMode(f.file.Dirent.Inode.StableAttr.Type.LinuxType()), nil
 }
 
+// GetXattr implements File.
+func (f *fsFile) GetXattr(ctx context.Context, name string) (string, error) {
+	return f.file.Dirent.Inode.GetXattr(ctx, name, 0)
+}
+
 // IncRef implements File.
 func (f *fsFile) IncRef() {
 	f.file.IncRef()
@@ -80,6 +80,11 @@ func (f *VFSFile) Type(ctx context.Context) (linux.FileMode, error) {
 	return linux.FileMode(stat.Mode).FileType(), nil
 }
 
+// GetXattr implements File.
+func (f *VFSFile) GetXattr(ctx context.Context, name string) (string, error) {
+	return f.file.GetXattr(ctx, &vfs.GetXattrOptions{Name: name})
+}
+
 // IncRef implements File.
 func (f *VFSFile) IncRef() {
 	f.file.IncRef()
@@ -79,4 +79,5 @@ func (c *cpuController) AddControlFiles(ctx context.Context, creds *auth.Credent
 	contents["cpu.cfs_period_us"] = c.fs.newStubControllerFile(ctx, creds, &c.cfsPeriod, true)
 	contents["cpu.cfs_quota_us"] = c.fs.newStubControllerFile(ctx, creds, &c.cfsQuota, true)
 	contents["cpu.shares"] = c.fs.newStubControllerFile(ctx, creds, &c.shares, true)
+	contents["cpu.pressure"] = c.fs.newControllerFile(ctx, creds, &pressureData{res: kernel.PressureCPU}, true)
 }
@@ -85,6 +85,25 @@ func (c *memoryController) AddControlFiles(ctx context.Context, creds *auth.Cred
 	contents["memory.soft_limit_in_bytes"] = c.fs.newStubControllerFile(ctx, creds, &c.softLimitBytes, true)
 	contents["memory.move_charge_at_immigrate"] = c.fs.newStubControllerFile(ctx, creds, &c.moveChargeAtImmigrate, true)
 	contents["memory.pressure_level"] = c.fs.newStaticControllerFile(ctx, creds, linux.FileMode(0644), fmt.Sprintf("%d\n", c.pressureLevel))
+	contents["memory.pressure"] = c.fs.newControllerFile(ctx, creds, &pressureData{res: kernel.PressureMemory}, true)
+}
+
+// pressureData implements vfs.DynamicBytesSource for the "pressure" control
+// files, e.g. memory.pressure.
+//
+// +stateify savable
+type pressureData struct {
+	res kernel.PressureResource
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *pressureData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// Like memory.usage_in_bytes, this uses system-wide accounting since we
+	// know there is only one cgroup. Triggers are only supported on
+	// /proc/pressure files.
+	stats := kernel.KernelFromContext(ctx).PressureStats(d.res)
+	stats.WriteTo(buf)
+	return nil
 }
 
 // +stateify savable
@@ -82,7 +82,40 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, initVal uint64, sem
 	return &efd.vfsfd, nil
 }
 
-// HostFD returns the host eventfd associated with this event.
+// NewFromHost creates a new event fd backed by hostFD, which must be a host
+// eventfd. The returned file description takes ownership of hostFD.
+//
+// Reads, writes and readiness are passed through to hostFD, so the counter and
+// EFD_SEMAPHORE mode are those of the host eventfd and wakeups are shared with
+// host processes that hold the same eventfd.
+func NewFromHost(ctx context.Context, vfsObj *vfs.VirtualFilesystem, hostFD int, flags uint32) (*vfs.FileDescription, error) {
+	// Blocking is handled in the sentry.
+	if err := unix.SetNonblock(hostFD, true); err != nil {
+		return nil, err
+	}
+
+	vd := vfsObj.NewAnonVirtualDentry("[eventfd]")
+	defer vd.DecRef(ctx)
+	efd := &EventFileDescription{
+		hostfd: hostFD,
+	}
+	if err := fdnotifier.AddFD(int32(hostFD), &efd.queue); err != nil {
+		return nil, err
+	}
+	if err := efd.vfsfd.Init(efd, flags, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+		DenyPRead:         true,
+		DenyPWrite:        true,
+		DenySpliceIn:      true,
+	}); err != nil {
+		fdnotifier.RemoveFD(int32(hostFD))
+		return nil, err
+	}
+	return &efd.vfsfd, nil
+}
+
+// HostFD returns the host eventfd associated with this event, converting the
+// event to a host-backed eventfd if it isn't one already.
 func (efd *EventFileDescription) HostFD() (int, error) {
 	efd.mu.Lock()
 	defer efd.mu.Unlock()
@@ -95,22 +128,51 @@ func (efd *EventFileDescription) HostFD() (int, error) {
 		flags |= linux.EFD_SEMAPHORE
 	}
 
-	fd, _, errno := unix.Syscall(unix.SYS_EVENTFD2, uintptr(efd.val), uintptr(flags), 0)
+	// eventfd2(2) takes a 32-bit initial value, so the counter is transferred
+	// with a write instead.
+	fd, _, errno := unix.Syscall(unix.SYS_EVENTFD2, 0, uintptr(flags), 0)
 	if errno != 0 {
 		return -1, errno
 	}
-
-	if err := fdnotifier.AddFD(int32(fd), &efd.queue); err != nil {
-		if closeErr := unix.Close(int(fd)); closeErr != nil {
-			log.Warningf("close(%d) eventfd failed: %v", fd, closeErr)
+	hostfd := int(fd)
+	closeHostFD := func() {
+		if closeErr := unix.Close(hostfd); closeErr != nil {
+			log.Warningf("close(%d) eventfd failed: %v", hostfd, closeErr)
+		}
+	}
+	if efd.val != 0 {
+		var buf [8]byte
+		hostarch.ByteOrder.PutUint64(buf[:], efd.val)
+		if _, err := unix.Write(hostfd, buf[:]); err != nil {
+			closeHostFD()
+			return -1, err
 		}
+	}
+
+	if err := fdnotifier.AddFD(int32(hostfd), &efd.queue); err != nil {
+		closeHostFD()
+		return -1, err
+	}
+	// Waiters registered before the conversion must be notified of events on
+	// the host eventfd, which fdnotifier.AddFD doesn't arm.
+	if err := fdnotifier.UpdateFD(int32(hostfd)); err != nil {
+		fdnotifier.RemoveFD(int32(hostfd))
+		closeHostFD()
 		return -1, err
 	}
 
-	efd.hostfd = int(fd)
+	efd.hostfd = hostfd
+	efd.val = 0
 	return efd.hostfd, nil
 }
 
+// beforeSave is invoked by stateify.
+func (efd *EventFileDescription) beforeSave() {
+	if efd.hostfd >= 0 {
+		panic("eventfd.EventFileDescription backed by a host eventfd is not savable")
+	}
+}
+
 // Release implements vfs.FileDescriptionImpl.Release.
 func (efd *EventFileDescription) Release(context.Context) {
 	efd.mu.Lock()
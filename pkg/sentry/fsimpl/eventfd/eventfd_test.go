@@ -16,8 +16,12 @@ package eventfd
 
 import (
 	"testing"
+	"time"
 
+	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/usermem"
@@ -97,3 +101,141 @@ func TestEventFDStat(t *testing.T) {
 		t.Errorf("eventfd size should be 0")
 	}
 }
+
+// hostEventFD returns a host eventfd and a duplicate of it acting as the host
+// peer.
+func hostEventFD(t *testing.T, flags int) (int, int) {
+	hostFD, err := unix.Eventfd(0, flags|unix.EFD_CLOEXEC)
+	if err != nil {
+		t.Fatalf("eventfd: %v", err)
+	}
+	peer, err := unix.Dup(hostFD)
+	if err != nil {
+		unix.Close(hostFD)
+		t.Fatalf("dup: %v", err)
+	}
+	t.Cleanup(func() { unix.Close(peer) })
+	return hostFD, peer
+}
+
+func readEvent(ctx context.Context, t *testing.T, fd *vfs.FileDescription) uint64 {
+	var buf [8]byte
+	if _, err := fd.Read(ctx, usermem.BytesIOSequence(buf[:]), vfs.ReadOptions{}); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	return hostarch.ByteOrder.Uint64(buf[:])
+}
+
+func writeEvent(ctx context.Context, t *testing.T, fd *vfs.FileDescription, val uint64) {
+	var buf [8]byte
+	hostarch.ByteOrder.PutUint64(buf[:], val)
+	if _, err := fd.Write(ctx, usermem.BytesIOSequence(buf[:]), vfs.WriteOptions{}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+func readHostEvent(t *testing.T, fd int) uint64 {
+	var buf [8]byte
+	if _, err := unix.Read(fd, buf[:]); err != nil {
+		t.Fatalf("host read: %v", err)
+	}
+	return hostarch.ByteOrder.Uint64(buf[:])
+}
+
+func writeHostEvent(t *testing.T, fd int, val uint64) {
+	var buf [8]byte
+	hostarch.ByteOrder.PutUint64(buf[:], val)
+	if _, err := unix.Write(fd, buf[:]); err != nil {
+		t.Fatalf("host write: %v", err)
+	}
+}
+
+func waitReadable(t *testing.T, ch <-chan struct{}) {
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Didn't get notified of EventIn after host write")
+	}
+}
+
+func TestEventFDFromHost(t *testing.T) {
+	ctx := contexttest.Context(t)
+	vfsObj := &vfs.VirtualFilesystem{}
+	if err := vfsObj.Init(ctx); err != nil {
+		t.Fatalf("VFS init: %v", err)
+	}
+
+	hostFD, peer := hostEventFD(t, unix.EFD_SEMAPHORE)
+	eventfd, err := NewFromHost(ctx, vfsObj, hostFD, linux.O_RDWR)
+	if err != nil {
+		unix.Close(hostFD)
+		t.Fatalf("NewFromHost() failed: %v", err)
+	}
+	defer eventfd.DecRef(ctx)
+
+	w, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	if err := eventfd.EventRegister(&w); err != nil {
+		t.Fatalf("EventRegister(): %v", err)
+	}
+	defer eventfd.EventUnregister(&w)
+
+	// A write by the host peer must wake sentry waiters.
+	writeHostEvent(t, peer, 2)
+	waitReadable(t, ch)
+
+	// Reads must follow the host eventfd's EFD_SEMAPHORE mode.
+	for i := 0; i < 2; i++ {
+		if got := readEvent(ctx, t, eventfd); got != 1 {
+			t.Errorf("Read() = %d, want 1", got)
+		}
+	}
+	if got := eventfd.Readiness(waiter.ReadableEvents); got != 0 {
+		t.Errorf("Readiness() = %v after draining, want 0", got)
+	}
+
+	// Writes in the sentry must be visible to the host peer.
+	writeEvent(ctx, t, eventfd, 3)
+	if got := readHostEvent(t, peer); got != 1 {
+		t.Errorf("host read = %d, want 1", got)
+	}
+}
+
+func TestEventFDToHost(t *testing.T) {
+	ctx := contexttest.Context(t)
+	vfsObj := &vfs.VirtualFilesystem{}
+	if err := vfsObj.Init(ctx); err != nil {
+		t.Fatalf("VFS init: %v", err)
+	}
+
+	eventfd, err := New(ctx, vfsObj, 2, true, linux.O_RDWR)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	defer eventfd.DecRef(ctx)
+
+	// Register before the conversion, which must not lose the waiter.
+	w, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	if err := eventfd.EventRegister(&w); err != nil {
+		t.Fatalf("EventRegister(): %v", err)
+	}
+	defer eventfd.EventUnregister(&w)
+
+	hostFD, err := eventfd.Impl().(*EventFileDescription).HostFD()
+	if err != nil {
+		t.Fatalf("HostFD() failed: %v", err)
+	}
+
+	// The counter and semaphore mode are carried over to the host eventfd.
+	for i := 0; i < 2; i++ {
+		if got := readHostEvent(t, hostFD); got != 1 {
+			t.Errorf("host read = %d, want 1", got)
+		}
+	}
+
+	// A host write must wake the waiter registered before the conversion.
+	writeHostEvent(t, hostFD, 1)
+	waitReadable(t, ch)
+	if got := readEvent(ctx, t, eventfd); got != 1 {
+		t.Errorf("Read() = %d, want 1", got)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// directoryFD implements vfs.FileDescriptionImpl for directories.
+//
+// +stateify savable
+type directoryFD struct {
+	kernfs.GenericDirectoryFD
+}
+
+func newDirectoryFD(mnt *vfs.Mount, d *kernfs.Dentry, i *inode, opts *vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &directoryFD{}
+	if err := fd.GenericDirectoryFD.Init(&i.children, &i.locks, opts, kernfs.GenericDirectoryFDOptions{
+		SeekEnd: kernfs.SeekEndZero,
+	}); err != nil {
+		return nil, err
+	}
+	if err := fd.VFSFileDescription().Init(fd, opts.Flags, mnt, d.VFSDentry(), &vfs.FileDescriptionOptions{}); err != nil {
+		return nil, err
+	}
+	return fd.VFSFileDescription(), nil
+}
+
+func (fd *directoryFD) inode() *inode {
+	return fd.VFSFileDescription().Dentry().Impl().(*kernfs.Dentry).Inode().(*inode)
+}
+
+// ListXattr implements vfs.FileDescriptionImpl.ListXattr.
+func (fd *directoryFD) ListXattr(ctx context.Context, size uint64) ([]string, error) {
+	return fd.inode().listXattr(ctx, auth.CredentialsFromContext(ctx), size)
+}
+
+// GetXattr implements vfs.FileDescriptionImpl.GetXattr.
+func (fd *directoryFD) GetXattr(ctx context.Context, opts vfs.GetXattrOptions) (string, error) {
+	return fd.inode().getXattr(ctx, auth.CredentialsFromContext(ctx), &opts)
+}
+
+// SetXattr implements vfs.FileDescriptionImpl.SetXattr.
+func (fd *directoryFD) SetXattr(ctx context.Context, opts vfs.SetXattrOptions) error {
+	return linuxerr.EROFS
+}
+
+// RemoveXattr implements vfs.FileDescriptionImpl.RemoveXattr.
+func (fd *directoryFD) RemoveXattr(ctx context.Context, name string) error {
+	return linuxerr.EROFS
+}
+
+// StatFS implements vfs.FileDescriptionImpl.StatFS.
+func (fd *directoryFD) StatFS(ctx context.Context) (linux.Statfs, error) {
+	return fd.inode().StatFS(ctx, fd.VFSFileDescription().Mount().Filesystem())
+}
@@ -0,0 +1,341 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disklayout
+
+import (
+	"errors"
+	"sort"
+)
+
+// Directory entry file types (ext4_dir_entry_2.file_type).
+const (
+	FileTypeUnknown  = 0
+	FileTypeRegular  = 1
+	FileTypeDir      = 2
+	FileTypeCharDev  = 3
+	FileTypeBlockDev = 4
+	FileTypeFIFO     = 5
+	FileTypeSocket   = 6
+	FileTypeSymlink  = 7
+
+	// fileTypeTail marks the dirent that holds the checksum of a directory
+	// block (struct ext4_dir_entry_tail).
+	fileTypeTail = 0xde
+)
+
+const (
+	direntHeaderSize = 8
+	direntTailSize   = 12
+
+	// MaxNameLen is the maximum length of a directory entry name.
+	MaxNameLen = 255
+
+	// Offsets in the first (root) block of an htree directory.
+	dxRootInfoOffset    = 0x18
+	dxRootEntriesOffset = 0x20
+
+	// Offset of the entries in other htree interior nodes, which start with a
+	// fake empty dirent.
+	dxNodeEntriesOffset = 8
+
+	dxEntrySize = 8
+)
+
+// Dirent is a directory entry.
+type Dirent struct {
+	Inode uint32
+	Name  string
+
+	// Type is one of the FileType constants. It's FileTypeUnknown if the
+	// filesystem doesn't have the filetype feature.
+	Type uint8
+}
+
+// errBadDX is returned by the htree lookup path on malformed htree metadata.
+// As in Linux, such directories are searched linearly instead.
+var errBadDX = errors.New("bad htree directory")
+
+// parseDirBlock calls fn for every in-use entry in the directory block b,
+// stopping early if fn returns false. It verifies b's checksum if it has one.
+func (v *Volume) parseDirBlock(dir *Inode, lblk uint64, b []byte, fn func(Dirent) bool) error {
+	end := len(b)
+	// With metadata_csum, leaf blocks end with a fake dirent holding their
+	// checksum. htree interior blocks have a different tail, which is not
+	// verified.
+	if tail := b[len(b)-direntTailSize:]; le.Uint32(tail[0:]) == 0 && le.Uint16(tail[4:]) == direntTailSize && tail[6] == 0 && tail[7] == fileTypeTail {
+		if v.sb.HasRoCompat(RoCompatMetadataCsum) {
+			want := le.Uint32(tail[8:])
+			if got := crc32c(dir.csumSeed, b[:len(b)-direntTailSize]); got != want {
+				return badChecksumf("inode %d: directory block %d checksum is %#x, want %#x", dir.Num, lblk, got, want)
+			}
+		}
+		end -= direntTailSize
+	}
+	filetype := v.sb.HasIncompat(IncompatFiletype)
+	for off := 0; off < end; {
+		if off+direntHeaderSize > end {
+			return corruptf("inode %d: truncated directory entry in block %d at offset %d", dir.Num, lblk, off)
+		}
+		e := b[off:]
+		ino := le.Uint32(e[0:])
+		recLen := int(le.Uint16(e[4:]))
+		if recLen == 0xffff || recLen == 0 && len(b) == 65536 {
+			// Encoding of 65536-byte records; see
+			// fs/ext4/ext4.h:ext4_rec_len_from_disk().
+			recLen = 65536
+		}
+		nameLen := int(e[6])
+		typ := e[7]
+		if !filetype {
+			nameLen |= int(typ) << 8
+			typ = FileTypeUnknown
+		}
+		if recLen < direntHeaderSize || recLen%4 != 0 || off+recLen > end || direntHeaderSize+nameLen > recLen {
+			return corruptf("inode %d: bad directory entry in block %d at offset %d (rec_len %d, name_len %d)", dir.Num, lblk, off, recLen, nameLen)
+		}
+		if ino != 0 {
+			if nameLen == 0 {
+				return corruptf("inode %d: empty directory entry name in block %d at offset %d", dir.Num, lblk, off)
+			}
+			if !fn(Dirent{Inode: ino, Name: string(e[direntHeaderSize : direntHeaderSize+nameLen]), Type: typ}) {
+				return nil
+			}
+		}
+		off += recLen
+	}
+	return nil
+}
+
+// readDirBlock reads logical block lblk of directory dir into b.
+func (v *Volume) readDirBlock(dir *Inode, lblk uint64, b []byte) error {
+	if (lblk+1)*v.sb.BlockSize > dir.Size {
+		return corruptf("inode %d: directory block %d is past the end of the directory", dir.Num, lblk)
+	}
+	m, err := v.MapBlock(dir, lblk)
+	if err != nil {
+		return err
+	}
+	if m.Physical == 0 {
+		return corruptf("inode %d: directory has a hole at block %d", dir.Num, lblk)
+	}
+	return v.readBlock(m.Physical, b)
+}
+
+// ReadDir calls fn for every entry in directory dir, including "." and "..",
+// in on-disk order. It stops early if fn returns false.
+func (v *Volume) ReadDir(dir *Inode, fn func(Dirent) bool) error {
+	if !dir.IsDir() {
+		return corruptf("inode %d is not a directory", dir.Num)
+	}
+	bs := v.sb.BlockSize
+	if dir.Size%bs != 0 {
+		return corruptf("inode %d: directory size %d is not a multiple of the block size", dir.Num, dir.Size)
+	}
+	b := make([]byte, bs)
+	stop := false
+	for lblk := uint64(0); lblk < dir.Size/bs && !stop; lblk++ {
+		if err := v.readDirBlock(dir, lblk, b); err != nil {
+			return err
+		}
+		if err := v.parseDirBlock(dir, lblk, b, func(d Dirent) bool {
+			stop = !fn(d)
+			return !stop
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup returns the entry named name in directory dir. It returns an error
+// wrapping ErrNotFound if there is no such entry.
+func (v *Volume) Lookup(dir *Inode, name string) (Dirent, error) {
+	if !dir.IsDir() {
+		return Dirent{}, corruptf("inode %d is not a directory", dir.Num)
+	}
+	if len(name) == 0 || len(name) > MaxNameLen {
+		return Dirent{}, ErrNotFound
+	}
+	if dir.Flags&inodeFlagIndex != 0 && v.sb.HasCompat(CompatDirIndex) {
+		d, err := v.htreeLookup(dir, name)
+		if !errors.Is(err, errBadDX) {
+			return d, err
+		}
+	}
+	var (
+		found Dirent
+		ok    bool
+	)
+	if err := v.ReadDir(dir, func(d Dirent) bool {
+		if d.Name == name {
+			found, ok = d, true
+		}
+		return !ok
+	}); err != nil {
+		return Dirent{}, err
+	}
+	if !ok {
+		return Dirent{}, ErrNotFound
+	}
+	return found, nil
+}
+
+// dxFrame is a position in an htree interior node.
+type dxFrame struct {
+	node    []byte
+	entries int // offset of the first dx_entry
+	count   int
+	at      int // index of the current dx_entry
+}
+
+func (f *dxFrame) hash(i int) uint32 {
+	if i == 0 {
+		return 0
+	}
+	return le.Uint32(f.node[f.entries+i*dxEntrySize:])
+}
+
+func (f *dxFrame) block(i int) uint64 {
+	// The top 4 bits are reserved; see fs/ext4/namei.c:dx_get_block().
+	return uint64(le.Uint32(f.node[f.entries+i*dxEntrySize+4:]) & 0x0fffffff)
+}
+
+// htreeLookup looks up name in the hashed directory dir, as
+// fs/ext4/namei.c:ext4_dx_find_entry() does.
+func (v *Volume) htreeLookup(dir *Inode, name string) (Dirent, error) {
+	bs := v.sb.BlockSize
+	root := make([]byte, bs)
+	if err := v.readDirBlock(dir, 0, root); err != nil {
+		return Dirent{}, err
+	}
+	info := root[dxRootInfoOffset:]
+	version, infoLen, levels := info[4], info[5], int(info[6])
+	maxLevels := 2
+	if v.sb.HasIncompat(IncompatLargeDir) {
+		maxLevels = 3
+	}
+	if le.Uint32(info[0:]) != 0 || infoLen != 8 || levels >= maxLevels {
+		return Dirent{}, errBadDX
+	}
+	if version <= HashTEA && v.sb.Flags&flagUnsignedHash != 0 {
+		version += hashUnsignedIncrease
+	}
+	hash, ok := DirHash([]byte(name), version, v.sb.HashSeed)
+	if !ok {
+		return Dirent{}, errBadDX
+	}
+
+	// Walk down to the leaf block covering hash.
+	path := make([]dxFrame, 0, levels+1)
+	node, entries := root, dxRootEntriesOffset
+	for {
+		f, err := v.dxFrameAt(node, entries)
+		if err != nil {
+			return Dirent{}, err
+		}
+		f.at = sort.Search(f.count, func(i int) bool { return i > 0 && f.hash(i) > hash }) - 1
+		path = append(path, f)
+		if len(path) > levels {
+			break
+		}
+		node = make([]byte, bs)
+		if err := v.readDirBlock(dir, f.block(f.at), node); err != nil {
+			return Dirent{}, err
+		}
+		// Interior nodes start with an empty dirent covering the block.
+		if le.Uint32(node[0:]) != 0 || uint64(le.Uint16(node[4:])) != bs && !(bs == 65536 && le.Uint16(node[4:]) == 0) {
+			return Dirent{}, errBadDX
+		}
+		entries = dxNodeEntriesOffset
+	}
+
+	leaf := make([]byte, bs)
+	// Bound the number of leaves visited, in case the htree is cyclic.
+	for visited := uint64(0); visited < dir.Size/bs; visited++ {
+		f := &path[len(path)-1]
+		lblk := f.block(f.at)
+		if err := v.readDirBlock(dir, lblk, leaf); err != nil {
+			return Dirent{}, err
+		}
+		var (
+			found Dirent
+			ok    bool
+		)
+		if err := v.parseDirBlock(dir, lblk, leaf, func(d Dirent) bool {
+			if d.Name == name {
+				found, ok = d, true
+			}
+			return !ok
+		}); err != nil {
+			return Dirent{}, err
+		}
+		if ok {
+			return found, nil
+		}
+		// Entries with colliding hashes may continue in the next leaf, whose
+		// hash then has its low bit set; see
+		// fs/ext4/namei.c:ext4_htree_next_block().
+		more, err := v.dxNextLeaf(dir, path, hash)
+		if err != nil {
+			return Dirent{}, err
+		}
+		if !more {
+			return Dirent{}, ErrNotFound
+		}
+	}
+	return Dirent{}, errBadDX
+}
+
+// dxNextLeaf advances path to the next leaf if it may contain entries with
+// the given hash.
+func (v *Volume) dxNextLeaf(dir *Inode, path []dxFrame, hash uint32) (bool, error) {
+	i := len(path) - 1
+	for path[i].at+1 >= path[i].count {
+		if i == 0 {
+			return false, nil
+		}
+		i--
+	}
+	path[i].at++
+	if path[i].hash(path[i].at)&^1 != hash {
+		return false, nil
+	}
+	// Descend to the first leaf under the new position.
+	for ; i+1 < len(path); i++ {
+		node := make([]byte, v.sb.BlockSize)
+		if err := v.readDirBlock(dir, path[i].block(path[i].at), node); err != nil {
+			return false, err
+		}
+		f, err := v.dxFrameAt(node, dxNodeEntriesOffset)
+		if err != nil {
+			return false, err
+		}
+		path[i+1] = f
+	}
+	return true, nil
+}
+
+// dxFrameAt validates the dx_countlimit at node[entries:].
+func (v *Volume) dxFrameAt(node []byte, entries int) (dxFrame, error) {
+	if entries+4 > len(node) {
+		return dxFrame{}, errBadDX
+	}
+	limit := int(le.Uint16(node[entries:]))
+	count := int(le.Uint16(node[entries+2:]))
+	if count == 0 || count > limit || entries+limit*dxEntrySize > len(node) {
+		return dxFrame{}, errBadDX
+	}
+	return dxFrame{node: node, entries: entries, count: count}, nil
+}
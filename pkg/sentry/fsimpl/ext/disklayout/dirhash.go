@@ -0,0 +1,197 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disklayout
+
+import (
+	"math/bits"
+)
+
+// Directory hash algorithms (dx_root_info.hash_version).
+const (
+	HashLegacy           = 0
+	HashHalfMD4          = 1
+	HashTEA              = 2
+	HashLegacyUnsigned   = 3
+	HashHalfMD4Unsigned  = 4
+	HashTEAUnsigned      = 5
+	hashUnsignedIncrease = HashLegacyUnsigned - HashLegacy
+)
+
+// htreeEOF is EXT4_HTREE_EOF_32BIT.
+const htreeEOF = 0x7fffffff
+
+// defaultHashSeed is used when the superblock's s_hash_seed is all zeros.
+var defaultHashSeed = [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+
+// DirHash returns the major hash of name used to index htree directories, as
+// computed by Linux's fs/ext4/hash.c:ext4fs_dirhash(). ok is false if version
+// isn't a known algorithm.
+func DirHash(name []byte, version uint8, seed [4]uint32) (hash uint32, ok bool) {
+	buf := defaultHashSeed
+	if seed != [4]uint32{} {
+		buf = seed
+	}
+	unsigned := false
+	switch version {
+	case HashLegacyUnsigned:
+		unsigned = true
+		fallthrough
+	case HashLegacy:
+		hash = dxHackHash(name, unsigned)
+	case HashHalfMD4Unsigned:
+		unsigned = true
+		fallthrough
+	case HashHalfMD4:
+		var in [8]uint32
+		for p := name; len(p) > 0; p = p[min(32, len(p)):] {
+			str2hashbuf(p, in[:], unsigned)
+			halfMD4Transform(&buf, &in)
+		}
+		hash = buf[1]
+	case HashTEAUnsigned:
+		unsigned = true
+		fallthrough
+	case HashTEA:
+		var in [4]uint32
+		for p := name; len(p) > 0; p = p[min(16, len(p)):] {
+			str2hashbuf(p, in[:], unsigned)
+			teaTransform(&buf, &in)
+		}
+		hash = buf[0]
+	default:
+		return 0, false
+	}
+	hash &^= 1
+	if hash == htreeEOF<<1 {
+		hash = (htreeEOF - 1) << 1
+	}
+	return hash, true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// char converts c to an int32 as C would convert a (signed or unsigned) char.
+func char(c byte, unsigned bool) int32 {
+	if unsigned {
+		return int32(c)
+	}
+	return int32(int8(c))
+}
+
+func dxHackHash(name []byte, unsigned bool) uint32 {
+	hash0, hash1 := uint32(0x12a3fe2d), uint32(0x37abe8f9)
+	for _, c := range name {
+		hash := hash1 + (hash0 ^ uint32(char(c, unsigned)*7152373))
+		if hash&0x80000000 != 0 {
+			hash -= 0x7fffffff
+		}
+		hash1 = hash0
+		hash0 = hash
+	}
+	return hash0 << 1
+}
+
+// str2hashbuf fills buf with the first 4*len(buf) bytes of msg, padded with
+// a value derived from len(msg).
+func str2hashbuf(msg []byte, buf []uint32, unsigned bool) {
+	pad := uint32(len(msg)) | uint32(len(msg))<<8
+	pad |= pad << 16
+	if len(msg) > 4*len(buf) {
+		msg = msg[:4*len(buf)]
+	}
+	val := pad
+	n := 0
+	for i, c := range msg {
+		val = uint32(char(c, unsigned)) + val<<8
+		if i%4 == 3 {
+			buf[n] = val
+			n++
+			val = pad
+		}
+	}
+	if n < len(buf) {
+		buf[n] = val
+		n++
+	}
+	for ; n < len(buf); n++ {
+		buf[n] = pad
+	}
+}
+
+func teaTransform(buf *[4]uint32, in *[4]uint32) {
+	const delta = 0x9e3779b9
+	var sum uint32
+	b0, b1 := buf[0], buf[1]
+	a, b, c, d := in[0], in[1], in[2], in[3]
+	for n := 0; n < 16; n++ {
+		sum += delta
+		b0 += ((b1 << 4) + a) ^ (b1 + sum) ^ ((b1 >> 5) + b)
+		b1 += ((b0 << 4) + c) ^ (b0 + sum) ^ ((b0 >> 5) + d)
+	}
+	buf[0] += b0
+	buf[1] += b1
+}
+
+func halfMD4Transform(buf *[4]uint32, in *[8]uint32) {
+	const (
+		k1 = 0
+		k2 = 013240474631
+		k3 = 015666365641
+	)
+	f := func(x, y, z uint32) uint32 { return z ^ (x & (y ^ z)) }
+	g := func(x, y, z uint32) uint32 { return (x & y) + ((x ^ y) & z) }
+	h := func(x, y, z uint32) uint32 { return x ^ y ^ z }
+	round := func(fn func(x, y, z uint32) uint32, a *uint32, b, c, d, x uint32, s int) {
+		*a = bits.RotateLeft32(*a+fn(b, c, d)+x, s)
+	}
+	a, b, c, d := buf[0], buf[1], buf[2], buf[3]
+
+	round(f, &a, b, c, d, in[0]+k1, 3)
+	round(f, &d, a, b, c, in[1]+k1, 7)
+	round(f, &c, d, a, b, in[2]+k1, 11)
+	round(f, &b, c, d, a, in[3]+k1, 19)
+	round(f, &a, b, c, d, in[4]+k1, 3)
+	round(f, &d, a, b, c, in[5]+k1, 7)
+	round(f, &c, d, a, b, in[6]+k1, 11)
+	round(f, &b, c, d, a, in[7]+k1, 19)
+
+	round(g, &a, b, c, d, in[1]+k2, 3)
+	round(g, &d, a, b, c, in[3]+k2, 5)
+	round(g, &c, d, a, b, in[5]+k2, 9)
+	round(g, &b, c, d, a, in[7]+k2, 13)
+	round(g, &a, b, c, d, in[0]+k2, 3)
+	round(g, &d, a, b, c, in[2]+k2, 5)
+	round(g, &c, d, a, b, in[4]+k2, 9)
+	round(g, &b, c, d, a, in[6]+k2, 13)
+
+	round(h, &a, b, c, d, in[3]+k3, 3)
+	round(h, &d, a, b, c, in[7]+k3, 9)
+	round(h, &c, d, a, b, in[2]+k3, 11)
+	round(h, &b, c, d, a, in[6]+k3, 15)
+	round(h, &a, b, c, d, in[1]+k3, 3)
+	round(h, &d, a, b, c, in[5]+k3, 9)
+	round(h, &c, d, a, b, in[0]+k3, 11)
+	round(h, &b, c, d, a, in[4]+k3, 15)
+
+	buf[0] += a
+	buf[1] += b
+	buf[2] += c
+	buf[3] += d
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package disklayout reads the on-disk format of ext2, ext3 and ext4
+// filesystems.
+//
+// Everything read from the disk is untrusted: all structures are bounds
+// checked before use, and malformed metadata is reported as ErrCorrupted
+// rather than causing a panic. The package never writes to the disk.
+package disklayout
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+var (
+	// ErrCorrupted is returned (wrapped) when on-disk metadata is
+	// inconsistent.
+	ErrCorrupted = errors.New("filesystem is corrupted")
+
+	// ErrBadChecksum is returned (wrapped) when on-disk metadata doesn't match
+	// its checksum.
+	ErrBadChecksum = errors.New("metadata checksum mismatch")
+
+	// ErrUnsupported is returned (wrapped) when the filesystem, or a file in
+	// it, uses a feature this package can't read.
+	ErrUnsupported = errors.New("unsupported filesystem feature")
+
+	// ErrNotFound is returned by Volume.Lookup when the directory has no entry
+	// with the given name.
+	ErrNotFound = errors.New("no such directory entry")
+)
+
+func corruptf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrCorrupted, fmt.Sprintf(format, args...))
+}
+
+func badChecksumf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrBadChecksum, fmt.Sprintf(format, args...))
+}
+
+func unsupportedf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrUnsupported, fmt.Sprintf(format, args...))
+}
+
+var le = binary.LittleEndian
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// crc32c returns the CRC32-C of b continuing from crc. Unlike hash/crc32, it
+// doesn't invert crc before and after the update; this matches Linux's
+// crc32c(), which ext4 uses for metadata_csum.
+func crc32c(crc uint32, b []byte) uint32 {
+	return ^crc32.Update(^crc, castagnoli, b)
+}
+
+// crc32cUint32 is equivalent to crc32c(crc, <v in little-endian>).
+func crc32cUint32(crc, v uint32) uint32 {
+	var b [4]byte
+	le.PutUint32(b[:], v)
+	return crc32c(crc, b[:])
+}
+
+// crc16 returns the CRC16 (polynomial 0x8005, bit-reversed) of b continuing
+// from crc, as computed by Linux's lib/crc16.c. ext4 uses it for group
+// descriptor checksums when the filesystem has gdt_csum but not
+// metadata_csum.
+func crc16(crc uint16, b []byte) uint16 {
+	for _, c := range b {
+		crc ^= uint16(c)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,507 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disklayout
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// The test images were created from the same directory tree with:
+//
+//	mkfs.ext4 -b 4096 -I 256 -L testvol -U 11111111-2222-3333-4444-555555555555 \
+//	    -E root_owner=0:0,hash_seed=5d8f1f29-4c0e-4d8e-8c7e-0f1e2d3c4b5a -d src ext4.img 8M
+//	mkfs.ext2 -b 1024 -I 128 -U 11111111-2222-3333-4444-666666666666 \
+//	    -E root_owner=0:0,hash_seed=5d8f1f29-4c0e-4d8e-8c7e-0f1e2d3c4b5a -d src ext2.img 8M
+//	e2fsck -fyD ext4.img; e2fsck -fyD ext2.img
+//
+// e2fsck -D indexes the directories. The tree contains:
+//
+//	hello.txt   "hello\n", with xattrs user.small="v" (and, in ext4.img only,
+//	            user.large, 1000 bytes of 'L')
+//	hardlink    hard link to hello.txt
+//	fastlink    symlink to "hello.txt"
+//	slowlink    symlink to 100 'x's
+//	sparse      "middle" at 1MB and "end" at 3MB
+//	huge        "start" at 0 and "past4g" at 5GB
+//	data        300000 bytes, byte i is (i*7)%251
+//	frag        40 blocks of 4096 bytes of byte i+1 at 8192*i, for i in [0, 40)
+//	big/        file0000 to file1999
+//	links/      6000 hard links to target, named n{34}%05d
+//	target      "t"
+//	dir/        empty
+var images = []string{"ext4.img.gz", "ext2.img.gz"}
+
+func openImage(t *testing.T, name string) (*Volume, []byte) {
+	t.Helper()
+	path, err := testutil.FindFile("pkg/sentry/fsimpl/ext/disklayout/testdata/" + name)
+	if err != nil {
+		t.Fatalf("FindFile(%q): %v", name, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open(%q): %v", path, err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	img, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading %q: %v", path, err)
+	}
+	v, err := Open(bytes.NewReader(img))
+	if err != nil {
+		t.Fatalf("Open(%q): %v", name, err)
+	}
+	return v, img
+}
+
+func lookupPath(v *Volume, path string) (*Inode, error) {
+	in, err := v.ReadInode(RootIno)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(path, "/") {
+		d, err := v.Lookup(in, name)
+		if err != nil {
+			return nil, fmt.Errorf("Lookup(%q): %w", name, err)
+		}
+		if in, err = v.ReadInode(d.Inode); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+func mustLookup(t *testing.T, v *Volume, path string) *Inode {
+	t.Helper()
+	in, err := lookupPath(v, path)
+	if err != nil {
+		t.Fatalf("lookup %q: %v", path, err)
+	}
+	return in
+}
+
+func readFile(t *testing.T, v *Volume, in *Inode, off int64, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	got, err := v.ReadAt(in, b, off)
+	if err != nil && got != n {
+		t.Fatalf("ReadAt(inode %d, %d, %d): %v", in.Num, n, off, err)
+	}
+	return b
+}
+
+func TestSuperBlock(t *testing.T) {
+	v, _ := openImage(t, "ext4.img.gz")
+	sb := v.SuperBlock()
+	if sb.BlockSize != 4096 {
+		t.Errorf("BlockSize = %d, want 4096", sb.BlockSize)
+	}
+	if sb.VolumeName != "testvol" {
+		t.Errorf("VolumeName = %q, want testvol", sb.VolumeName)
+	}
+	if !sb.HasRoCompat(RoCompatMetadataCsum) || !sb.HasIncompat(IncompatExtents|Incompat64Bit) {
+		t.Errorf("unexpected features: compat %#x incompat %#x ro_compat %#x", sb.FeatureCompat, sb.FeatureIncompat, sb.FeatureRoCompat)
+	}
+	if want := [16]byte{0x11, 0x11, 0x11, 0x11, 0x22, 0x22, 0x33, 0x33, 0x44, 0x44, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55}; sb.UUID != want {
+		t.Errorf("UUID = %x, want %x", sb.UUID, want)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	for _, name := range images {
+		t.Run(name, func(t *testing.T) {
+			v, _ := openImage(t, name)
+
+			hello := mustLookup(t, v, "hello.txt")
+			if !hello.IsRegular() || hello.Size != 6 || hello.LinksCount != 2 {
+				t.Errorf("hello.txt: mode %#o size %d links %d", hello.Mode, hello.Size, hello.LinksCount)
+			}
+			if got := readFile(t, v, hello, 0, 6); string(got) != "hello\n" {
+				t.Errorf("hello.txt contents = %q", got)
+			}
+			if link := mustLookup(t, v, "hardlink"); link.Num != hello.Num {
+				t.Errorf("hardlink is inode %d, want %d", link.Num, hello.Num)
+			}
+
+			sparse := mustLookup(t, v, "sparse")
+			if got := readFile(t, v, sparse, 1<<20, 6); string(got) != "middle" {
+				t.Errorf("sparse at 1MB = %q", got)
+			}
+			if got := readFile(t, v, sparse, 3<<20, 3); string(got) != "end" {
+				t.Errorf("sparse at 3MB = %q", got)
+			}
+			if got := readFile(t, v, sparse, 4096, 8192); !bytes.Equal(got, make([]byte, 8192)) {
+				t.Errorf("sparse hole isn't zeroed")
+			}
+
+			huge := mustLookup(t, v, "huge")
+			if huge.Size != 5<<30+6 {
+				t.Errorf("huge size = %d", huge.Size)
+			}
+			if got := readFile(t, v, huge, 0, 5); string(got) != "start" {
+				t.Errorf("huge at 0 = %q", got)
+			}
+			if got := readFile(t, v, huge, 5<<30, 6); string(got) != "past4g" {
+				t.Errorf("huge at 5GB = %q", got)
+			}
+			if n, err := v.ReadAt(huge, make([]byte, 10), 5<<30); n != 6 || err == nil {
+				t.Errorf("read past EOF returned (%d, %v), want (6, EOF)", n, err)
+			}
+
+			data := mustLookup(t, v, "data")
+			got := readFile(t, v, data, 0, 300000)
+			for i, c := range got {
+				if c != byte(i*7%251) {
+					t.Fatalf("data[%d] = %d, want %d", i, c, i*7%251)
+				}
+			}
+
+			frag := mustLookup(t, v, "frag")
+			if frag.Size != 79*4096 {
+				t.Errorf("frag size = %d", frag.Size)
+			}
+			for i := 0; i < 79; i++ {
+				want := make([]byte, 4096)
+				if i%2 == 0 {
+					want = bytes.Repeat([]byte{byte(i/2 + 1)}, 4096)
+				}
+				if got := readFile(t, v, frag, int64(i)*4096, 4096); !bytes.Equal(got, want) {
+					t.Fatalf("frag block %d has wrong contents", i)
+				}
+			}
+
+			for path, want := range map[string]string{
+				"fastlink": "hello.txt",
+				"slowlink": strings.Repeat("x", 100),
+			} {
+				in := mustLookup(t, v, path)
+				target, err := v.Readlink(in)
+				if err != nil || target != want {
+					t.Errorf("Readlink(%q) = (%q, %v), want %q", path, target, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	for _, name := range images {
+		t.Run(name, func(t *testing.T) {
+			v, _ := openImage(t, name)
+			for _, tc := range []struct {
+				dir    string
+				count  int
+				format string
+			}{
+				{"big", 2000, "file%04d"},
+				{"links", 6000, strings.Repeat("n", 34) + "%05d"},
+			} {
+				dir := mustLookup(t, v, tc.dir)
+				if dir.Flags&inodeFlagIndex == 0 {
+					t.Errorf("%s isn't indexed", tc.dir)
+				}
+				names := make(map[string]bool)
+				if err := v.ReadDir(dir, func(d Dirent) bool {
+					names[d.Name] = true
+					return true
+				}); err != nil {
+					t.Fatalf("ReadDir(%s): %v", tc.dir, err)
+				}
+				if len(names) != tc.count+2 || !names["."] || !names[".."] {
+					t.Errorf("ReadDir(%s) returned %d names, want %d", tc.dir, len(names), tc.count+2)
+				}
+				for i := 0; i < tc.count; i++ {
+					name := fmt.Sprintf(tc.format, i)
+					// Use the htree directly, so that a broken htree isn't
+					// hidden by the linear fallback.
+					d, err := v.htreeLookup(dir, name)
+					if err != nil {
+						t.Fatalf("htreeLookup(%s, %q): %v", tc.dir, name, err)
+					}
+					if d.Name != name || d.Type != FileTypeRegular {
+						t.Fatalf("htreeLookup(%s, %q) = %+v", tc.dir, name, d)
+					}
+				}
+				for _, missing := range []string{"nonexistent", fmt.Sprintf(tc.format, tc.count), strings.Repeat("z", MaxNameLen+1)} {
+					if _, err := v.Lookup(dir, missing); !errors.Is(err, ErrNotFound) {
+						t.Errorf("Lookup(%s, %q) = %v, want ErrNotFound", tc.dir, missing, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestXattrs(t *testing.T) {
+	for _, tc := range []struct {
+		image string
+		want  map[string]string
+	}{
+		{"ext4.img.gz", map[string]string{"user.small": "v", "user.large": strings.Repeat("L", 1000)}},
+		{"ext2.img.gz", map[string]string{"user.small": "v"}},
+	} {
+		t.Run(tc.image, func(t *testing.T) {
+			v, _ := openImage(t, tc.image)
+			xattrs, err := v.Xattrs(mustLookup(t, v, "hello.txt"))
+			if err != nil {
+				t.Fatalf("Xattrs: %v", err)
+			}
+			got := make(map[string]string)
+			for _, x := range xattrs {
+				got[x.Name] = string(x.Value)
+			}
+			if len(got) != len(tc.want) {
+				t.Errorf("got xattrs %v, want %v", got, tc.want)
+			}
+			for name, value := range tc.want {
+				if got[name] != value {
+					t.Errorf("xattr %s = %q, want %q", name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertACL(t *testing.T) {
+	// user::rw-, user:1000:r--, group::r--, mask::r--, other::---
+	disk := []byte{
+		1, 0, 0, 0,
+		0x1, 0, 6, 0,
+		0x2, 0, 4, 0, 0xe8, 0x3, 0, 0,
+		0x4, 0, 4, 0,
+		0x10, 0, 4, 0,
+		0x20, 0, 0, 0,
+	}
+	want := []byte{
+		2, 0, 0, 0,
+		0x1, 0, 6, 0, 0xff, 0xff, 0xff, 0xff,
+		0x2, 0, 4, 0, 0xe8, 0x3, 0, 0,
+		0x4, 0, 4, 0, 0xff, 0xff, 0xff, 0xff,
+		0x10, 0, 4, 0, 0xff, 0xff, 0xff, 0xff,
+		0x20, 0, 0, 0, 0xff, 0xff, 0xff, 0xff,
+	}
+	got, err := convertACL(1, disk)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("convertACL = (%v, %v), want %v", got, err, want)
+	}
+	if _, err := convertACL(1, disk[:10]); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("convertACL of truncated ACL = %v, want ErrCorrupted", err)
+	}
+}
+
+func TestDirHash(t *testing.T) {
+	// Expected values were computed with debugfs's dx_hash command.
+	seed := [4]uint32{0x291f8f5d, 0x8e4d0e4c, 0x1e0f7e8c, 0x5a4b3c2d}
+	long := []byte(strings.Repeat("\xc3\xa9xyz", 8) + "q")
+	for _, tc := range []struct {
+		name    []byte
+		version uint8
+		seed    [4]uint32
+		want    uint32
+	}{
+		{[]byte("a"), HashLegacy, [4]uint32{}, 0xe74b53e2},
+		{[]byte("a"), HashHalfMD4, [4]uint32{}, 0xd5fa7d7a},
+		{[]byte("a"), HashTEA, [4]uint32{}, 0x6d0ea4c0},
+		{[]byte("a"), HashHalfMD4, seed, 0xbcaf68a8},
+		{[]byte("a"), HashTEA, seed, 0x5b773910},
+		{[]byte("file0000"), HashLegacy, seed, 0x206ea930},
+		{[]byte("file0000"), HashHalfMD4, seed, 0x824be4d2},
+		{[]byte("file0000"), HashTEA, seed, 0xccc4eb3a},
+		{long, HashLegacy, [4]uint32{}, 0x89e9dfa4},
+		{long, HashHalfMD4, [4]uint32{}, 0xf438b578},
+		{long, HashTEA, [4]uint32{}, 0x55185840},
+		{long, HashLegacyUnsigned, [4]uint32{}, 0x8c6f69b2},
+		{long, HashHalfMD4Unsigned, [4]uint32{}, 0x67ca6ba8},
+		{long, HashTEAUnsigned, [4]uint32{}, 0x6e164c8c},
+		{long, HashHalfMD4, seed, 0xa922b4d6},
+		{long, HashTEA, seed, 0x07724036},
+		{long, HashHalfMD4Unsigned, seed, 0x79614d1a},
+		{long, HashTEAUnsigned, seed, 0x677cb804},
+	} {
+		got, ok := DirHash(tc.name, tc.version, tc.seed)
+		if !ok || got != tc.want {
+			t.Errorf("DirHash(%q, %d, %x) = (%#x, %t), want %#x", tc.name, tc.version, tc.seed, got, ok, tc.want)
+		}
+	}
+	if _, ok := DirHash([]byte("a"), 6, seed); ok {
+		t.Errorf("DirHash with siphash succeeded, want failure")
+	}
+}
+
+// setSuperBlockChecksum recomputes the superblock checksum of img.
+func setSuperBlockChecksum(img []byte) {
+	sb := img[SuperBlockOffset : SuperBlockOffset+SuperBlockSize]
+	le.PutUint32(sb[superBlockChecksumOffset:], crc32c(^uint32(0), sb[:superBlockChecksumOffset]))
+}
+
+func TestUnsupportedFeatures(t *testing.T) {
+	_, img := openImage(t, "ext4.img.gz")
+	for _, tc := range []struct {
+		off  int
+		bit  uint32
+		name string
+	}{
+		{0x60, IncompatInlineData, "inline_data"},
+		{0x60, IncompatEncrypt, "encrypt"},
+		{0x60, IncompatRecover, "needs_recovery"},
+		{0x60, 0x80000000, "0x80000000"},
+		{0x64, RoCompatBigalloc, "bigalloc"},
+	} {
+		b := append([]byte(nil), img...)
+		sb := b[SuperBlockOffset:]
+		le.PutUint32(sb[tc.off:], le.Uint32(sb[tc.off:])|tc.bit)
+		setSuperBlockChecksum(b)
+		_, err := Open(bytes.NewReader(b))
+		if !errors.Is(err, ErrUnsupported) || !strings.Contains(err.Error(), tc.name) {
+			t.Errorf("Open with feature %s = %v, want ErrUnsupported naming it", tc.name, err)
+		}
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	v, img := openImage(t, "ext4.img.gz")
+
+	// Corrupt the superblock without updating its checksum.
+	b := append([]byte(nil), img...)
+	b[SuperBlockOffset+0x78] ^= 1
+	if _, err := Open(bytes.NewReader(b)); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("Open with corrupted superblock = %v, want ErrBadChecksum", err)
+	}
+
+	// Corrupt an inode.
+	hello := mustLookup(t, v, "hello.txt")
+	table, err := v.inodeTable(0)
+	if err != nil {
+		t.Fatalf("inodeTable: %v", err)
+	}
+	off := int(table*v.BlockSize()) + int(hello.Num-1)*int(v.SuperBlock().InodeSize)
+	b = append([]byte(nil), img...)
+	b[off+0x10] ^= 1 // mtime
+	v2, err := Open(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := v2.ReadInode(hello.Num); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("ReadInode of corrupted inode = %v, want ErrBadChecksum", err)
+	}
+
+	// Corrupt a directory block.
+	dir := mustLookup(t, v, "big")
+	m, err := v.MapBlock(dir, 1)
+	if err != nil {
+		t.Fatalf("MapBlock: %v", err)
+	}
+	b = append([]byte(nil), img...)
+	b[int(m.Physical*v.BlockSize())+20] ^= 1
+	v2, err = Open(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := v2.ReadDir(dir, func(Dirent) bool { return true }); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("ReadDir of corrupted directory = %v, want ErrBadChecksum", err)
+	}
+
+	// Corrupt the extent tree block of frag.
+	frag := mustLookup(t, v, "frag")
+	child := uint64(le.Uint32(frag.data[extentHeaderSize+4:]))
+	b = append([]byte(nil), img...)
+	b[int(child*v.BlockSize())+extentHeaderSize] ^= 1
+	v2, err = Open(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := v2.MapBlock(frag, 0); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("MapBlock with corrupted extent block = %v, want ErrBadChecksum", err)
+	}
+}
+
+// walk reads everything reachable from the root of v, ignoring errors.
+func walk(v *Volume) {
+	root, err := v.ReadInode(RootIno)
+	if err != nil {
+		return
+	}
+	seen := make(map[uint32]bool)
+	var visit func(in *Inode, depth int)
+	visit = func(in *Inode, depth int) {
+		if seen[in.Num] || depth > 10 {
+			return
+		}
+		seen[in.Num] = true
+		v.Xattrs(in)
+		switch {
+		case in.IsDir():
+			var children []Dirent
+			v.ReadDir(in, func(d Dirent) bool {
+				children = append(children, d)
+				return true
+			})
+			for _, d := range children {
+				v.Lookup(in, d.Name)
+				if child, err := v.ReadInode(d.Inode); err == nil {
+					visit(child, depth+1)
+				}
+			}
+		case in.IsSymlink():
+			v.Readlink(in)
+		default:
+			b := make([]byte, 64<<10)
+			for off := int64(0); off < int64(in.Size) && off < 1<<20; off += int64(len(b)) {
+				if _, err := v.ReadAt(in, b, off); err != nil {
+					break
+				}
+			}
+		}
+	}
+	visit(root, 0)
+}
+
+// TestCorruptedImages checks that randomly corrupted images don't cause
+// panics or hangs.
+func TestCorruptedImages(t *testing.T) {
+	for _, name := range images {
+		t.Run(name, func(t *testing.T) {
+			_, img := openImage(t, name)
+			r := rand.New(rand.NewSource(1))
+			// Only corrupt metadata: the first 1400 blocks of the images are
+			// almost all metadata.
+			limit := 1400 * 1024
+			for i := 0; i < 50; i++ {
+				b := append([]byte(nil), img...)
+				for j := 0; j < 200; j++ {
+					b[r.Intn(limit)] = byte(r.Intn(256))
+				}
+				v, err := Open(bytes.NewReader(b))
+				if err != nil {
+					continue
+				}
+				walk(v)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disklayout
+
+import (
+	"io"
+	"sort"
+)
+
+const (
+	extentMagic      = 0xf30a
+	extentHeaderSize = 12
+	extentEntrySize  = 12
+
+	// maxExtentDepth is the maximum depth of an extent tree, per
+	// fs/ext4/ext4_extents.h:EXT4_MAX_EXTENT_DEPTH.
+	maxExtentDepth = 5
+
+	// maxInitExtentLen is the maximum length of an initialized extent. Longer
+	// ee_len values denote unwritten extents of length ee_len-32768.
+	maxInitExtentLen = 32768
+
+	// maxLogicalBlocks is the number of addressable logical blocks in a file.
+	maxLogicalBlocks = 1 << 32
+
+	// Block map layout: i_block holds 12 direct pointers followed by pointers
+	// to an indirect, double-indirect and triple-indirect block.
+	directBlocks = 12
+)
+
+// Mapping describes how a range of contiguous logical blocks in a file is
+// stored.
+type Mapping struct {
+	// Physical is the physical block holding the first logical block in the
+	// range, or 0 if the range is a hole (or an unwritten extent), which
+	// reads as zeros.
+	Physical uint64
+
+	// Length is the number of blocks in the range. It's always at least 1.
+	Length uint64
+}
+
+// extentHeader is struct ext4_extent_header.
+type extentHeader struct {
+	entries uint16
+	depth   uint16
+}
+
+// parseExtentNode validates the extent tree node in b.
+func parseExtentNode(ino uint32, b []byte) (extentHeader, error) {
+	if magic := le.Uint16(b[0:]); magic != extentMagic {
+		return extentHeader{}, corruptf("inode %d: bad extent header magic %#x", ino, magic)
+	}
+	h := extentHeader{
+		entries: le.Uint16(b[2:]),
+		depth:   le.Uint16(b[6:]),
+	}
+	max := le.Uint16(b[4:])
+	if h.entries > max || extentHeaderSize+int(max)*extentEntrySize > len(b) {
+		return extentHeader{}, corruptf("inode %d: extent node has %d of %d entries in %d bytes", ino, h.entries, max, len(b))
+	}
+	if h.depth > maxExtentDepth {
+		return extentHeader{}, corruptf("inode %d: extent tree depth %d is too large", ino, h.depth)
+	}
+	return h, nil
+}
+
+// verifyExtentBlock checks the checksum in the ext4_extent_tail of a
+// non-root extent tree node.
+func (v *Volume) verifyExtentBlock(in *Inode, pblk uint64, b []byte) error {
+	if !v.sb.HasRoCompat(RoCompatMetadataCsum) {
+		return nil
+	}
+	tail := extentHeaderSize + int(le.Uint16(b[4:]))*extentEntrySize
+	if tail+4 > len(b) {
+		return corruptf("inode %d: extent block %d has no room for a checksum", in.Num, pblk)
+	}
+	want := le.Uint32(b[tail:])
+	if got := crc32c(in.csumSeed, b[:tail]); got != want {
+		return badChecksumf("inode %d: extent block %d checksum is %#x, want %#x", in.Num, pblk, got, want)
+	}
+	return nil
+}
+
+// MapBlock returns the mapping of the longest run of logical blocks of in,
+// starting at lblk, that are either stored contiguously or are all holes.
+func (v *Volume) MapBlock(in *Inode, lblk uint64) (Mapping, error) {
+	if lblk >= maxLogicalBlocks {
+		return Mapping{Length: 1}, nil
+	}
+	var (
+		m   Mapping
+		err error
+	)
+	if in.Flags&inodeFlagExtents != 0 {
+		m, err = v.mapExtents(in, uint32(lblk))
+	} else {
+		m, err = v.mapIndirect(in, uint32(lblk))
+	}
+	if err != nil {
+		return Mapping{}, err
+	}
+	if m.Physical != 0 {
+		if _, err := v.BlockOffset(m.Physical, m.Length); err != nil {
+			return Mapping{}, corruptf("inode %d: logical block %d maps past the end of the filesystem", in.Num, lblk)
+		}
+	}
+	return m, nil
+}
+
+func (v *Volume) mapExtents(in *Inode, lblk uint32) (Mapping, error) {
+	node := in.data[:]
+	// end is the first logical block past the subtree rooted at node.
+	end := uint64(maxLogicalBlocks)
+	hole := func(next uint64) Mapping {
+		if next > end {
+			next = end
+		}
+		return Mapping{Length: next - uint64(lblk)}
+	}
+	var blk []byte
+	wantDepth := -1
+	for {
+		h, err := parseExtentNode(in.Num, node)
+		if err != nil {
+			return Mapping{}, err
+		}
+		if wantDepth >= 0 && int(h.depth) != wantDepth {
+			return Mapping{}, corruptf("inode %d: extent node at depth %d, want %d", in.Num, h.depth, wantDepth)
+		}
+		entries := int(h.entries)
+		entry := func(i int) []byte {
+			off := extentHeaderSize + i*extentEntrySize
+			return node[off : off+extentEntrySize]
+		}
+		// Find the last entry starting at or before lblk. Both leaf and index
+		// entries begin with the first logical block they cover.
+		i := sort.Search(entries, func(i int) bool {
+			return le.Uint32(entry(i)) > lblk
+		}) - 1
+		if i+1 < entries {
+			if next := uint64(le.Uint32(entry(i + 1))); next < end {
+				end = next
+			}
+		}
+		if i < 0 {
+			return hole(end), nil
+		}
+		e := entry(i)
+		first := uint64(le.Uint32(e[0:]))
+
+		if h.depth == 0 {
+			length := uint64(le.Uint16(e[4:]))
+			unwritten := false
+			if length > maxInitExtentLen {
+				length -= maxInitExtentLen
+				unwritten = true
+			}
+			if length == 0 {
+				return Mapping{}, corruptf("inode %d: empty extent at logical block %d", in.Num, first)
+			}
+			if uint64(lblk) >= first+length {
+				return hole(end), nil
+			}
+			m := Mapping{Length: first + length - uint64(lblk)}
+			if m.Length > end-uint64(lblk) {
+				return Mapping{}, corruptf("inode %d: overlapping extents at logical block %d", in.Num, lblk)
+			}
+			if !unwritten {
+				start := uint64(le.Uint32(e[8:])) | uint64(le.Uint16(e[6:]))<<32
+				m.Physical = start + uint64(lblk) - first
+			}
+			return m, nil
+		}
+
+		child := uint64(le.Uint32(e[4:])) | uint64(le.Uint16(e[8:]))<<32
+		if blk == nil {
+			blk = make([]byte, v.sb.BlockSize)
+		}
+		if err := v.readBlock(child, blk); err != nil {
+			return Mapping{}, err
+		}
+		if err := v.verifyExtentBlock(in, child, blk); err != nil {
+			return Mapping{}, err
+		}
+		node = blk
+		wantDepth = int(h.depth) - 1
+	}
+}
+
+func (v *Volume) mapIndirect(in *Inode, lblk uint32) (Mapping, error) {
+	ptrsPerBlock := v.sb.BlockSize / 4
+	// run returns the mapping of the run of pointers starting at ptrs[0],
+	// limited to the n pointers in ptrs.
+	run := func(ptrs []byte) Mapping {
+		first := uint64(le.Uint32(ptrs))
+		m := Mapping{Physical: first, Length: 1}
+		for n := uint64(len(ptrs) / 4); m.Length < n; m.Length++ {
+			p := uint64(le.Uint32(ptrs[4*m.Length:]))
+			if first == 0 && p != 0 || first != 0 && p != first+m.Length {
+				break
+			}
+		}
+		return m
+	}
+
+	if lblk < directBlocks {
+		return run(in.data[4*lblk : 4*directBlocks]), nil
+	}
+
+	// Find the level of indirection containing lblk, and lblk's index in the
+	// subtree rooted at that level's pointer.
+	idx := uint64(lblk) - directBlocks
+	span := ptrsPerBlock
+	level := 1
+	for idx >= span {
+		idx -= span
+		span *= ptrsPerBlock
+		level++
+		if level > 3 {
+			// Beyond the triple-indirect block.
+			return Mapping{Length: 1}, nil
+		}
+	}
+
+	ptr := uint64(le.Uint32(in.data[4*(directBlocks+level-1):]))
+	blk := make([]byte, v.sb.BlockSize)
+	for ; level > 0; level-- {
+		span /= ptrsPerBlock
+		if ptr == 0 {
+			// The remainder of the subtree is a hole.
+			return Mapping{Length: span*ptrsPerBlock - idx}, nil
+		}
+		if err := v.readBlock(ptr, blk); err != nil {
+			return Mapping{}, err
+		}
+		i := idx / span
+		idx %= span
+		if level == 1 {
+			return run(blk[4*i:]), nil
+		}
+		ptr = uint64(le.Uint32(blk[4*i:]))
+	}
+	panic("unreachable")
+}
+
+// ReadAt reads len(p) bytes of in's data starting at off into p. It returns
+// io.EOF if the read extends past in.Size.
+func (v *Volume) ReadAt(in *Inode, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, corruptf("negative offset %d", off)
+	}
+	bs := v.sb.BlockSize
+	done := 0
+	for done < len(p) {
+		pos := uint64(off) + uint64(done)
+		if pos >= in.Size {
+			return done, io.EOF
+		}
+		m, err := v.MapBlock(in, pos/bs)
+		if err != nil {
+			return done, err
+		}
+		n := m.Length*bs - pos%bs
+		if rem := in.Size - pos; n > rem {
+			n = rem
+		}
+		if rem := uint64(len(p) - done); n > rem {
+			n = rem
+		}
+		dst := p[done : done+int(n)]
+		if m.Physical == 0 {
+			for i := range dst {
+				dst[i] = 0
+			}
+		} else if err := readFull(v.r, dst, int64(m.Physical*bs+pos%bs)); err != nil {
+			return done, err
+		}
+		done += int(n)
+	}
+	return done, nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disklayout
+
+// Inode numbers with special meanings.
+const (
+	// RootIno is the inode number of the root directory.
+	RootIno = 2
+)
+
+// File type bits of Inode.Mode.
+const (
+	ModeTypeMask  = 0xf000
+	ModeFIFO      = 0x1000
+	ModeCharDev   = 0x2000
+	ModeDirectory = 0x4000
+	ModeBlockDev  = 0x6000
+	ModeRegular   = 0x8000
+	ModeSymlink   = 0xa000
+	ModeSocket    = 0xc000
+)
+
+// Inode flags (i_flags).
+const (
+	inodeFlagEncrypt    = 0x800
+	inodeFlagIndex      = 0x1000
+	inodeFlagHugeFile   = 0x40000
+	inodeFlagExtents    = 0x80000
+	inodeFlagEAInode    = 0x200000
+	inodeFlagInlineData = 0x10000000
+	inodeFlagCasefold   = 0x40000000
+)
+
+const (
+	// inodeDataSize is the size of i_block, which holds the block map, the
+	// root of the extent tree, or the target of a fast symlink.
+	inodeDataSize = 60
+
+	// Offsets of the inode checksum fields.
+	inodeChecksumLoOffset = 0x7c
+	inodeChecksumHiOffset = 0x82
+
+	// Offset of the first field past the base 128-byte inode.
+	inodeExtraOffset = goodOldInodeSize
+)
+
+// Timestamp is an inode timestamp.
+//
+// +stateify savable
+type Timestamp struct {
+	Sec  int64
+	Nsec uint32
+}
+
+// Inode is a parsed struct ext4_inode.
+//
+// +stateify savable
+type Inode struct {
+	// Num is the inode number.
+	Num uint32
+
+	Mode       uint16
+	UID        uint32
+	GID        uint32
+	Size       uint64
+	LinksCount uint16
+
+	// Blocks is the number of 512-byte sectors allocated to the file,
+	// including extended attribute blocks.
+	Blocks uint64
+
+	Atime Timestamp
+	Mtime Timestamp
+	Ctime Timestamp
+
+	// Crtime is the creation time. It's only valid if HasCrtime is true.
+	Crtime    Timestamp
+	HasCrtime bool
+
+	Flags      uint32
+	Generation uint32
+
+	// FileACL is the block holding extended attributes that don't fit in the
+	// inode, or 0.
+	FileACL uint64
+
+	// data is i_block.
+	data [inodeDataSize]byte
+
+	// inlineXattrs is the in-inode extended attribute area (following
+	// i_extra_isize), which may be empty.
+	inlineXattrs []byte
+
+	// csumSeed seeds the checksums of metadata owned by this inode, if the
+	// filesystem has metadata_csum.
+	csumSeed uint32
+}
+
+// FileType returns the file type bits of in.Mode.
+func (in *Inode) FileType() uint16 {
+	return in.Mode & ModeTypeMask
+}
+
+// IsDir returns true if in is a directory.
+func (in *Inode) IsDir() bool {
+	return in.FileType() == ModeDirectory
+}
+
+// IsRegular returns true if in is a regular file.
+func (in *Inode) IsRegular() bool {
+	return in.FileType() == ModeRegular
+}
+
+// IsSymlink returns true if in is a symbolic link.
+func (in *Inode) IsSymlink() bool {
+	return in.FileType() == ModeSymlink
+}
+
+// DeviceNumber returns the device number of a character or block device
+// inode, encoded as by Linux's new_encode_dev() or old_encode_dev().
+func (in *Inode) DeviceNumber() (major, minor uint32) {
+	// See fs/ext4/inode.c:ext4_iget(): the old 16-bit format is used if
+	// i_block[0] is non-zero, and the new 32-bit format in i_block[1]
+	// otherwise.
+	if old := le.Uint32(in.data[0:]); old != 0 {
+		return (old >> 8) & 0xff, old & 0xff
+	}
+	dev := le.Uint32(in.data[4:])
+	return (dev & 0xfff00) >> 8, (dev & 0xff) | ((dev >> 12) & 0xfff00)
+}
+
+// decodeTime decodes the timestamp whose seconds are stored at b[loOff:], and
+// whose extra field, if hasExtra, is stored at b[extraOff:].
+func decodeTime(b []byte, loOff, extraOff int, hasExtra bool) Timestamp {
+	ts := Timestamp{Sec: int64(int32(le.Uint32(b[loOff:])))}
+	if hasExtra {
+		// The low 2 bits of the extra field extend the seconds past 2038 and
+		// the remaining 30 hold nanoseconds.
+		e := le.Uint32(b[extraOff:])
+		ts.Sec += int64(e&3) << 32
+		ts.Nsec = e >> 2
+		if ts.Nsec >= 1e9 {
+			ts.Nsec = 0
+		}
+	}
+	return ts
+}
+
+// parseInode parses the raw on-disk inode b read from a filesystem described
+// by sb. It verifies b's checksum if the filesystem has metadata_csum.
+func parseInode(sb *SuperBlock, ino uint32, b []byte) (*Inode, error) {
+	in := &Inode{
+		Num:        ino,
+		Mode:       le.Uint16(b[0x0:]),
+		UID:        uint32(le.Uint16(b[0x2:])) | uint32(le.Uint16(b[0x78:]))<<16,
+		Size:       uint64(le.Uint32(b[0x4:])) | uint64(le.Uint32(b[0x6c:]))<<32,
+		GID:        uint32(le.Uint16(b[0x18:])) | uint32(le.Uint16(b[0x7a:]))<<16,
+		LinksCount: le.Uint16(b[0x1a:]),
+		Flags:      le.Uint32(b[0x20:]),
+		Generation: le.Uint32(b[0x64:]),
+		FileACL:    uint64(le.Uint32(b[0x68:])),
+	}
+	copy(in.data[:], b[0x28:0x28+inodeDataSize])
+
+	// Determine how much of the extended inode is in use.
+	extraEnd := uint64(inodeExtraOffset)
+	if sb.InodeSize > goodOldInodeSize {
+		extraIsize := uint64(le.Uint16(b[inodeExtraOffset:]))
+		extraEnd += extraIsize
+		if extraEnd > uint64(sb.InodeSize) || extraIsize&3 != 0 {
+			return nil, corruptf("inode %d: invalid i_extra_isize %d", ino, extraIsize)
+		}
+	}
+	fits := func(off, size uint64) bool { return off+size <= extraEnd }
+
+	if sb.HasRoCompat(RoCompatMetadataCsum) {
+		seed := crc32cUint32(sb.ChecksumSeed, ino)
+		seed = crc32cUint32(seed, in.Generation)
+		in.csumSeed = seed
+
+		want := uint32(le.Uint16(b[inodeChecksumLoOffset:]))
+		hasHi := fits(inodeChecksumHiOffset, 2)
+		if hasHi {
+			want |= uint32(le.Uint16(b[inodeChecksumHiOffset:])) << 16
+		}
+		var zero [2]byte
+		got := crc32c(seed, b[:inodeChecksumLoOffset])
+		got = crc32c(got, zero[:])
+		if hasHi {
+			got = crc32c(got, b[inodeChecksumLoOffset+2:inodeChecksumHiOffset])
+			got = crc32c(got, zero[:])
+			got = crc32c(got, b[inodeChecksumHiOffset+2:sb.InodeSize])
+		} else {
+			got = crc32c(got, b[inodeChecksumLoOffset+2:sb.InodeSize])
+			got &= 0xffff
+		}
+		if got != want {
+			return nil, badChecksumf("inode %d checksum is %#x, want %#x", ino, got, want)
+		}
+	}
+
+	if in.LinksCount == 0 {
+		return nil, corruptf("inode %d is not in use", ino)
+	}
+	if in.Flags&(inodeFlagInlineData|inodeFlagEncrypt|inodeFlagCasefold|inodeFlagEAInode) != 0 {
+		return nil, unsupportedf("inode %d has unsupported flags %#x", ino, in.Flags)
+	}
+
+	in.Blocks = uint64(le.Uint32(b[0x1c:]))
+	if sb.HasIncompat(Incompat64Bit) {
+		in.FileACL |= uint64(le.Uint16(b[0x76:])) << 32
+	}
+	if sb.HasRoCompat(RoCompatHugeFile) {
+		in.Blocks |= uint64(le.Uint16(b[0x74:])) << 32
+		if in.Flags&inodeFlagHugeFile != 0 {
+			// i_blocks is in units of filesystem blocks.
+			in.Blocks *= sb.BlockSize / 512
+		}
+	}
+
+	in.Ctime = decodeTime(b, 0xc, 0x84, fits(0x84, 4))
+	in.Mtime = decodeTime(b, 0x10, 0x88, fits(0x88, 4))
+	in.Atime = decodeTime(b, 0x8, 0x8c, fits(0x8c, 4))
+	if fits(0x90, 4) {
+		in.Crtime = decodeTime(b, 0x90, 0x94, fits(0x94, 4))
+		in.HasCrtime = true
+	}
+
+	if extraEnd < uint64(sb.InodeSize) {
+		in.inlineXattrs = append([]byte(nil), b[extraEnd:sb.InodeSize]...)
+	}
+	return in, nil
+}
@@ -0,0 +1,327 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disklayout
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SuperBlockOffset is the offset of the primary superblock from the
+	// start of the device, regardless of the block size.
+	SuperBlockOffset = 1024
+
+	// SuperBlockSize is the size of the on-disk superblock.
+	SuperBlockSize = 1024
+
+	superBlockMagic = 0xef53
+
+	// Offset of s_checksum, which covers everything before it.
+	superBlockChecksumOffset = 0x3fc
+
+	// Supported range of s_log_block_size. ext4 supports block sizes from
+	// 1KB to 64KB.
+	maxLogBlockSize = 6
+
+	goodOldInodeSize = 128
+	goodOldFirstIno  = 11
+	goodOldRev       = 0
+
+	minDescSize   = 32
+	minDescSize64 = 64
+	maxDescSize   = 1024
+
+	// s_flags bits.
+	flagSignedHash   = 0x1
+	flagUnsignedHash = 0x2
+
+	// s_checksum_type values.
+	checksumTypeCRC32C = 1
+)
+
+// Incompatible feature flags (s_feature_incompat). A filesystem using any
+// unsupported incompatible feature can't be read at all.
+const (
+	IncompatCompression = 0x1
+	IncompatFiletype    = 0x2
+	IncompatRecover     = 0x4
+	IncompatJournalDev  = 0x8
+	IncompatMetaBG      = 0x10
+	IncompatExtents     = 0x40
+	Incompat64Bit       = 0x80
+	IncompatMMP         = 0x100
+	IncompatFlexBG      = 0x200
+	IncompatEAInode     = 0x400
+	IncompatDirData     = 0x1000
+	IncompatCsumSeed    = 0x2000
+	IncompatLargeDir    = 0x4000
+	IncompatInlineData  = 0x8000
+	IncompatEncrypt     = 0x10000
+	IncompatCasefold    = 0x20000
+
+	supportedIncompat = IncompatFiletype | IncompatExtents | Incompat64Bit | IncompatMMP | IncompatFlexBG | IncompatCsumSeed | IncompatLargeDir
+)
+
+// Read-only compatible feature flags (s_feature_ro_compat). Since this
+// package never writes, a read-only compatible feature only needs to be
+// supported if it changes how the filesystem is read.
+const (
+	RoCompatSparseSuper   = 0x1
+	RoCompatLargeFile     = 0x2
+	RoCompatBtreeDir      = 0x4
+	RoCompatHugeFile      = 0x8
+	RoCompatGDTCsum       = 0x10
+	RoCompatDirNlink      = 0x20
+	RoCompatExtraIsize    = 0x40
+	RoCompatHasSnapshot   = 0x80
+	RoCompatQuota         = 0x100
+	RoCompatBigalloc      = 0x200
+	RoCompatMetadataCsum  = 0x400
+	RoCompatReplica       = 0x800
+	RoCompatReadonly      = 0x1000
+	RoCompatProject       = 0x2000
+	RoCompatSharedBlocks  = 0x4000
+	RoCompatVerity        = 0x8000
+	RoCompatOrphanPresent = 0x10000
+
+	supportedRoCompat = RoCompatSparseSuper | RoCompatLargeFile | RoCompatBtreeDir | RoCompatHugeFile | RoCompatGDTCsum | RoCompatDirNlink | RoCompatExtraIsize | RoCompatQuota | RoCompatMetadataCsum | RoCompatReadonly | RoCompatProject | RoCompatSharedBlocks | RoCompatVerity | RoCompatOrphanPresent
+)
+
+// Compatible feature flags (s_feature_compat). These never prevent reading
+// the filesystem.
+const (
+	CompatHasJournal = 0x4
+	CompatDirIndex   = 0x20
+)
+
+var incompatNames = map[uint32]string{
+	IncompatCompression: "compression",
+	IncompatFiletype:    "filetype",
+	IncompatRecover:     "needs_recovery",
+	IncompatJournalDev:  "journal_dev",
+	IncompatMetaBG:      "meta_bg",
+	IncompatExtents:     "extent",
+	Incompat64Bit:       "64bit",
+	IncompatMMP:         "mmp",
+	IncompatFlexBG:      "flex_bg",
+	IncompatEAInode:     "ea_inode",
+	IncompatDirData:     "dirdata",
+	IncompatCsumSeed:    "metadata_csum_seed",
+	IncompatLargeDir:    "large_dir",
+	IncompatInlineData:  "inline_data",
+	IncompatEncrypt:     "encrypt",
+	IncompatCasefold:    "casefold",
+}
+
+var roCompatNames = map[uint32]string{
+	RoCompatSparseSuper:   "sparse_super",
+	RoCompatLargeFile:     "large_file",
+	RoCompatBtreeDir:      "btree_dir",
+	RoCompatHugeFile:      "huge_file",
+	RoCompatGDTCsum:       "uninit_bg",
+	RoCompatDirNlink:      "dir_nlink",
+	RoCompatExtraIsize:    "extra_isize",
+	RoCompatHasSnapshot:   "snapshot",
+	RoCompatQuota:         "quota",
+	RoCompatBigalloc:      "bigalloc",
+	RoCompatMetadataCsum:  "metadata_csum",
+	RoCompatReplica:       "replica",
+	RoCompatReadonly:      "read-only",
+	RoCompatProject:       "project",
+	RoCompatSharedBlocks:  "shared_blocks",
+	RoCompatVerity:        "verity",
+	RoCompatOrphanPresent: "orphan_present",
+}
+
+// featureNames returns the names of the feature flags set in mask, using
+// names for known flags.
+func featureNames(mask uint32, names map[uint32]string) string {
+	var s []string
+	for bit := uint32(1); bit != 0; bit <<= 1 {
+		if mask&bit == 0 {
+			continue
+		}
+		if name, ok := names[bit]; ok {
+			s = append(s, name)
+		} else {
+			s = append(s, fmt.Sprintf("%#x", bit))
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+// SuperBlock is the subset of struct ext4_super_block used by this package.
+type SuperBlock struct {
+	InodesCount     uint32
+	BlocksCount     uint64
+	FreeBlocksCount uint64
+	FreeInodesCount uint32
+	FirstDataBlock  uint32
+	BlockSize       uint64
+	BlocksPerGroup  uint32
+	InodesPerGroup  uint32
+	RevLevel        uint32
+	InodeSize       uint16
+	FirstIno        uint32
+	FeatureCompat   uint32
+	FeatureIncompat uint32
+	FeatureRoCompat uint32
+	UUID            [16]byte
+	VolumeName      string
+	HashSeed        [4]uint32
+	DescSize        uint16
+	Flags           uint32
+	ChecksumType    uint8
+	ChecksumSeed    uint32
+}
+
+// ParseSuperBlock parses and validates the superblock in b, which must hold
+// the SuperBlockSize bytes at SuperBlockOffset on the device.
+//
+// ParseSuperBlock returns an error wrapping ErrUnsupported, naming the
+// offending features, if the filesystem can't be read by this package.
+func ParseSuperBlock(b []byte) (*SuperBlock, error) {
+	if len(b) < SuperBlockSize {
+		return nil, corruptf("superblock is %d bytes, want %d", len(b), SuperBlockSize)
+	}
+	if magic := le.Uint16(b[0x38:]); magic != superBlockMagic {
+		return nil, corruptf("bad superblock magic %#x", magic)
+	}
+	sb := &SuperBlock{
+		InodesCount:     le.Uint32(b[0x0:]),
+		BlocksCount:     uint64(le.Uint32(b[0x4:])),
+		FreeBlocksCount: uint64(le.Uint32(b[0xc:])),
+		FreeInodesCount: le.Uint32(b[0x10:]),
+		FirstDataBlock:  le.Uint32(b[0x14:]),
+		BlocksPerGroup:  le.Uint32(b[0x20:]),
+		InodesPerGroup:  le.Uint32(b[0x28:]),
+		RevLevel:        le.Uint32(b[0x4c:]),
+		InodeSize:       goodOldInodeSize,
+		FirstIno:        goodOldFirstIno,
+		DescSize:        minDescSize,
+		Flags:           le.Uint32(b[0x160:]),
+	}
+	logBlockSize := le.Uint32(b[0x18:])
+	if logBlockSize > maxLogBlockSize {
+		return nil, corruptf("invalid block size 2^(10+%d)", logBlockSize)
+	}
+	sb.BlockSize = 1024 << logBlockSize
+	if sb.RevLevel != goodOldRev {
+		// Dynamic revision: features and variable inode size.
+		sb.FirstIno = le.Uint32(b[0x54:])
+		sb.InodeSize = le.Uint16(b[0x58:])
+		sb.FeatureCompat = le.Uint32(b[0x5c:])
+		sb.FeatureIncompat = le.Uint32(b[0x60:])
+		sb.FeatureRoCompat = le.Uint32(b[0x64:])
+	}
+	copy(sb.UUID[:], b[0x68:0x78])
+	name := b[0x78:0x88]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	sb.VolumeName = string(name)
+	for i := range sb.HashSeed {
+		sb.HashSeed[i] = le.Uint32(b[0xec+4*i:])
+	}
+
+	if unsupported := sb.FeatureIncompat &^ supportedIncompat; unsupported != 0 {
+		return nil, unsupportedf("incompatible features %s", featureNames(unsupported, incompatNames))
+	}
+	if unsupported := sb.FeatureRoCompat &^ supportedRoCompat; unsupported != 0 {
+		return nil, unsupportedf("read-only compatible features %s", featureNames(unsupported, roCompatNames))
+	}
+
+	if sb.FeatureIncompat&Incompat64Bit != 0 {
+		sb.BlocksCount |= uint64(le.Uint32(b[0x150:])) << 32
+		sb.FreeBlocksCount |= uint64(le.Uint32(b[0x158:])) << 32
+		sb.DescSize = le.Uint16(b[0xfe:])
+		if sb.DescSize < minDescSize64 || sb.DescSize > maxDescSize || sb.DescSize&(sb.DescSize-1) != 0 {
+			return nil, corruptf("invalid group descriptor size %d", sb.DescSize)
+		}
+	}
+
+	if sb.FeatureRoCompat&RoCompatMetadataCsum != 0 {
+		sb.ChecksumType = b[0x175]
+		if sb.ChecksumType != checksumTypeCRC32C {
+			return nil, unsupportedf("metadata checksum type %d", sb.ChecksumType)
+		}
+		want := le.Uint32(b[superBlockChecksumOffset:])
+		if got := crc32c(^uint32(0), b[:superBlockChecksumOffset]); got != want {
+			return nil, badChecksumf("superblock checksum is %#x, want %#x", got, want)
+		}
+		if sb.FeatureIncompat&IncompatCsumSeed != 0 {
+			sb.ChecksumSeed = le.Uint32(b[0x270:])
+		} else {
+			sb.ChecksumSeed = crc32c(^uint32(0), sb.UUID[:])
+		}
+	} else if sb.FeatureIncompat&IncompatCsumSeed != 0 {
+		return nil, corruptf("metadata_csum_seed without metadata_csum")
+	}
+
+	if sb.InodeSize < goodOldInodeSize || uint64(sb.InodeSize) > sb.BlockSize || sb.InodeSize&(sb.InodeSize-1) != 0 {
+		return nil, corruptf("invalid inode size %d", sb.InodeSize)
+	}
+	if sb.BlocksPerGroup == 0 || uint64(sb.BlocksPerGroup) > 8*sb.BlockSize {
+		return nil, corruptf("invalid blocks per group %d", sb.BlocksPerGroup)
+	}
+	if sb.InodesPerGroup == 0 || uint64(sb.InodesPerGroup) > 8*sb.BlockSize {
+		return nil, corruptf("invalid inodes per group %d", sb.InodesPerGroup)
+	}
+	// The first data block holds the superblock: block 1 for 1KB blocks,
+	// block 0 otherwise.
+	wantFirstDataBlock := uint32(0)
+	if sb.BlockSize == 1024 {
+		wantFirstDataBlock = 1
+	}
+	if sb.FirstDataBlock != wantFirstDataBlock {
+		return nil, corruptf("invalid first data block %d for block size %d", sb.FirstDataBlock, sb.BlockSize)
+	}
+	if sb.BlocksCount <= uint64(sb.FirstDataBlock) {
+		return nil, corruptf("invalid block count %d", sb.BlocksCount)
+	}
+	if uint64(sb.InodesCount) > uint64(sb.GroupCount())*uint64(sb.InodesPerGroup) {
+		return nil, corruptf("inode count %d exceeds %d groups of %d inodes", sb.InodesCount, sb.GroupCount(), sb.InodesPerGroup)
+	}
+	if sb.FirstIno < goodOldFirstIno || sb.FirstIno > sb.InodesCount {
+		return nil, corruptf("invalid first inode %d", sb.FirstIno)
+	}
+	return sb, nil
+}
+
+// GroupCount returns the number of block groups in the filesystem.
+func (sb *SuperBlock) GroupCount() uint64 {
+	bpg := uint64(sb.BlocksPerGroup)
+	return (sb.BlocksCount - uint64(sb.FirstDataBlock) + bpg - 1) / bpg
+}
+
+// HasIncompat returns true if the filesystem has all incompatible features in
+// mask.
+func (sb *SuperBlock) HasIncompat(mask uint32) bool {
+	return sb.FeatureIncompat&mask == mask
+}
+
+// HasRoCompat returns true if the filesystem has all read-only compatible
+// features in mask.
+func (sb *SuperBlock) HasRoCompat(mask uint32) bool {
+	return sb.FeatureRoCompat&mask == mask
+}
+
+// HasCompat returns true if the filesystem has all compatible features in
+// mask.
+func (sb *SuperBlock) HasCompat(mask uint32) bool {
+	return sb.FeatureCompat&mask == mask
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disklayout
+
+import (
+	"io"
+)
+
+// Group descriptor fields.
+const (
+	groupDescInodeTableLo = 0x8
+	groupDescChecksum     = 0x1e
+	groupDescInodeTableHi = 0x28
+)
+
+// Volume reads an ext2, ext3 or ext4 filesystem.
+//
+// Volume is safe for concurrent use. It doesn't cache anything but the
+// superblock; callers are expected to cache inodes and file data.
+type Volume struct {
+	r  io.ReaderAt
+	sb *SuperBlock
+}
+
+// Open reads and validates the superblock of the filesystem on r.
+func Open(r io.ReaderAt) (*Volume, error) {
+	b := make([]byte, SuperBlockSize)
+	if err := readFull(r, b, SuperBlockOffset); err != nil {
+		return nil, err
+	}
+	sb, err := ParseSuperBlock(b)
+	if err != nil {
+		return nil, err
+	}
+	v := &Volume{r: r, sb: sb}
+	// Check that the group descriptor table is readable, so that an image
+	// truncated or corrupted past the superblock fails early.
+	if _, err := v.inodeTable(0); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SuperBlock returns the filesystem's superblock. The returned value must not
+// be modified.
+func (v *Volume) SuperBlock() *SuperBlock {
+	return v.sb
+}
+
+// BlockSize returns the filesystem block size in bytes.
+func (v *Volume) BlockSize() uint64 {
+	return v.sb.BlockSize
+}
+
+// readFull reads len(b) bytes at off from r.
+func readFull(r io.ReaderAt, b []byte, off int64) error {
+	n, err := r.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+	if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return corruptf("read of %d bytes at offset %d is past the end of the device", len(b), off)
+	}
+	return err
+}
+
+// BlockOffset returns the device offset of block pblk, after checking that
+// count blocks starting at pblk are within the filesystem. Block 0 holds the
+// boot sector and superblock, so it's never a valid target for metadata
+// references.
+func (v *Volume) BlockOffset(pblk, count uint64) (int64, error) {
+	if pblk+count < pblk || pblk+count > v.sb.BlocksCount || pblk == 0 && count != 0 {
+		return 0, corruptf("blocks [%d, %d) are outside the filesystem", pblk, pblk+count)
+	}
+	// BlocksCount * BlockSize can't overflow an int64: BlocksCount is at most
+	// 2^48 with 64bit, and BlockSize at most 2^16.
+	return int64(pblk * v.sb.BlockSize), nil
+}
+
+// readBlock reads block pblk into b, which must be BlockSize bytes long.
+func (v *Volume) readBlock(pblk uint64, b []byte) error {
+	off, err := v.BlockOffset(pblk, 1)
+	if err != nil {
+		return err
+	}
+	return readFull(v.r, b, off)
+}
+
+// inodeTable returns the first block of the inode table of group g.
+func (v *Volume) inodeTable(g uint64) (uint64, error) {
+	sb := v.sb
+	if g >= sb.GroupCount() {
+		return 0, corruptf("group %d out of range", g)
+	}
+	// The group descriptor table follows the primary superblock.
+	descSize := uint64(sb.DescSize)
+	gdtOff, err := v.BlockOffset(uint64(sb.FirstDataBlock)+1+g*descSize/sb.BlockSize, 1)
+	if err != nil {
+		return 0, err
+	}
+	b := make([]byte, descSize)
+	if err := readFull(v.r, b, gdtOff+int64(g*descSize%sb.BlockSize)); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case sb.HasRoCompat(RoCompatMetadataCsum):
+		got := crc32cUint32(sb.ChecksumSeed, uint32(g))
+		got = crc32c(got, b[:groupDescChecksum])
+		got = crc32c(got, []byte{0, 0})
+		got = crc32c(got, b[groupDescChecksum+2:])
+		if want := le.Uint16(b[groupDescChecksum:]); uint16(got) != want {
+			return 0, badChecksumf("group %d descriptor checksum is %#x, want %#x", g, uint16(got), want)
+		}
+	case sb.HasRoCompat(RoCompatGDTCsum):
+		var gb [4]byte
+		le.PutUint32(gb[:], uint32(g))
+		got := crc16(^uint16(0), sb.UUID[:])
+		got = crc16(got, gb[:])
+		got = crc16(got, b[:groupDescChecksum])
+		got = crc16(got, b[groupDescChecksum+2:])
+		if want := le.Uint16(b[groupDescChecksum:]); got != want {
+			return 0, badChecksumf("group %d descriptor checksum is %#x, want %#x", g, got, want)
+		}
+	}
+
+	table := uint64(le.Uint32(b[groupDescInodeTableLo:]))
+	if descSize >= minDescSize64 {
+		table |= uint64(le.Uint32(b[groupDescInodeTableHi:])) << 32
+	}
+	return table, nil
+}
+
+// ReadInode reads inode ino.
+func (v *Volume) ReadInode(ino uint32) (*Inode, error) {
+	sb := v.sb
+	if ino == 0 || ino > sb.InodesCount {
+		return nil, corruptf("inode %d out of range", ino)
+	}
+	g := uint64(ino-1) / uint64(sb.InodesPerGroup)
+	idx := uint64(ino-1) % uint64(sb.InodesPerGroup)
+	table, err := v.inodeTable(g)
+	if err != nil {
+		return nil, err
+	}
+	inodeSize := uint64(sb.InodeSize)
+	tableBlocks := (uint64(sb.InodesPerGroup)*inodeSize + sb.BlockSize - 1) / sb.BlockSize
+	off, err := v.BlockOffset(table, tableBlocks)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, inodeSize)
+	if err := readFull(v.r, b, off+int64(idx*inodeSize)); err != nil {
+		return nil, err
+	}
+	return parseInode(sb, ino, b)
+}
+
+// maxSymlinkLen is the maximum length of a symlink target, which ext4 limits
+// to a single block; Linux's PATH_MAX is the smallest block size used in
+// practice.
+const maxSymlinkLen = 4096
+
+// Readlink returns the target of symlink in.
+func (v *Volume) Readlink(in *Inode) (string, error) {
+	if !in.IsSymlink() {
+		return "", corruptf("inode %d is not a symlink", in.Num)
+	}
+	if in.Size == 0 || in.Size >= maxSymlinkLen || in.Size >= v.sb.BlockSize {
+		return "", corruptf("inode %d: invalid symlink length %d", in.Num, in.Size)
+	}
+	// Fast symlinks store the target in i_block, and have no data blocks
+	// (other than an extended attribute block); see
+	// fs/ext4/inode.c:ext4_inode_is_fast_symlink().
+	eaBlocks := uint64(0)
+	if in.FileACL != 0 {
+		eaBlocks = v.sb.BlockSize / 512
+	}
+	if in.Blocks == eaBlocks {
+		if in.Size >= inodeDataSize {
+			return "", corruptf("inode %d: fast symlink length %d is too long", in.Num, in.Size)
+		}
+		return string(in.data[:in.Size]), nil
+	}
+	b := make([]byte, in.Size)
+	if _, err := v.ReadAt(in, b, 0); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
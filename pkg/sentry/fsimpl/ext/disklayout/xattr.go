@@ -0,0 +1,182 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disklayout
+
+const (
+	xattrMagic           = 0xea020000
+	xattrBlockHeaderSize = 32
+	xattrBlockChecksum   = 0x10
+	xattrEntryHeaderSize = 16
+
+	// POSIX ACL xattr formats. See fs/ext4/acl.h and
+	// include/uapi/linux/posix_acl_xattr.h.
+	ext4ACLVersion       = 1
+	posixACLXattrVersion = 2
+	aclUserObj           = 0x1
+	aclUser              = 0x2
+	aclGroupObj          = 0x4
+	aclGroup             = 0x8
+	aclMask              = 0x10
+	aclOther             = 0x20
+	aclUndefinedID       = 0xffffffff
+)
+
+// Name prefixes indexed by ext4_xattr_entry.e_name_index. See
+// fs/ext4/xattr.c:ext4_xattr_handler_map.
+var xattrPrefixes = map[uint8]string{
+	1: "user.",
+	2: "system.posix_acl_access",
+	3: "system.posix_acl_default",
+	4: "trusted.",
+	6: "security.",
+	7: "system.",
+	8: "system.richacl",
+}
+
+// Xattr is an extended attribute.
+type Xattr struct {
+	Name  string
+	Value []byte
+}
+
+// Xattrs returns in's extended attributes, both those stored in the inode and
+// those in its extended attribute block.
+func (v *Volume) Xattrs(in *Inode) ([]Xattr, error) {
+	var xattrs []Xattr
+	if b := in.inlineXattrs; len(b) >= 4 && le.Uint32(b) == xattrMagic {
+		// In-inode value offsets are relative to the first entry.
+		var err error
+		if xattrs, err = parseXattrEntries(in.Num, b[4:], 0, b[4:], xattrs); err != nil {
+			return nil, err
+		}
+	}
+	if in.FileACL != 0 {
+		b := make([]byte, v.sb.BlockSize)
+		if err := v.readBlock(in.FileACL, b); err != nil {
+			return nil, err
+		}
+		if magic := le.Uint32(b[0:]); magic != xattrMagic {
+			return nil, corruptf("inode %d: bad xattr block magic %#x", in.Num, magic)
+		}
+		if blocks := le.Uint32(b[8:]); blocks != 1 {
+			return nil, corruptf("inode %d: xattr block spans %d blocks", in.Num, blocks)
+		}
+		if v.sb.HasRoCompat(RoCompatMetadataCsum) {
+			var nb [8]byte
+			le.PutUint64(nb[:], in.FileACL)
+			got := crc32c(v.sb.ChecksumSeed, nb[:])
+			got = crc32c(got, b[:xattrBlockChecksum])
+			got = crc32c(got, []byte{0, 0, 0, 0})
+			got = crc32c(got, b[xattrBlockChecksum+4:])
+			if want := le.Uint32(b[xattrBlockChecksum:]); got != want {
+				return nil, badChecksumf("inode %d: xattr block %d checksum is %#x, want %#x", in.Num, in.FileACL, got, want)
+			}
+		}
+		var err error
+		if xattrs, err = parseXattrEntries(in.Num, b, xattrBlockHeaderSize, b, xattrs); err != nil {
+			return nil, err
+		}
+	}
+	return xattrs, nil
+}
+
+// parseXattrEntries appends the extended attributes described by the
+// ext4_xattr_entry list starting at b[off:] to xattrs. Entry value offsets are
+// relative to values.
+func parseXattrEntries(ino uint32, b []byte, off int, values []byte, xattrs []Xattr) ([]Xattr, error) {
+	// The list is terminated by 4 zero bytes.
+	for off+4 <= len(b) && le.Uint32(b[off:]) != 0 {
+		if off+xattrEntryHeaderSize > len(b) {
+			return nil, corruptf("inode %d: truncated xattr entry", ino)
+		}
+		e := b[off:]
+		nameLen := int(e[0])
+		index := e[1]
+		valueOff := int(le.Uint16(e[2:]))
+		valueInum := le.Uint32(e[4:])
+		valueSize := int(le.Uint32(e[8:]))
+		if xattrEntryHeaderSize+nameLen > len(e) {
+			return nil, corruptf("inode %d: truncated xattr name", ino)
+		}
+		name := e[xattrEntryHeaderSize : xattrEntryHeaderSize+nameLen]
+		off += (xattrEntryHeaderSize + nameLen + 3) &^ 3
+
+		if valueInum != 0 {
+			return nil, unsupportedf("inode %d: xattr value stored in inode %d", ino, valueInum)
+		}
+		if valueSize < 0 || valueOff+valueSize > len(values) {
+			return nil, corruptf("inode %d: xattr value [%d, %d) out of range", ino, valueOff, valueOff+valueSize)
+		}
+		value := values[valueOff : valueOff+valueSize]
+
+		prefix, ok := xattrPrefixes[index]
+		if !ok {
+			// Linux ignores attributes with unknown prefixes.
+			continue
+		}
+		if index == 2 || index == 3 {
+			if nameLen != 0 {
+				continue
+			}
+			acl, err := convertACL(ino, value)
+			if err != nil {
+				return nil, err
+			}
+			value = acl
+		}
+		xattrs = append(xattrs, Xattr{
+			Name:  prefix + string(name),
+			Value: append([]byte(nil), value...),
+		})
+	}
+	return xattrs, nil
+}
+
+// convertACL converts a POSIX ACL from ext4's compact on-disk format to the
+// format returned by getxattr(2), as fs/ext4/acl.c:ext4_acl_from_disk() and
+// posix_acl_to_xattr() do.
+func convertACL(ino uint32, b []byte) ([]byte, error) {
+	if len(b) < 4 || le.Uint32(b) != ext4ACLVersion {
+		return nil, corruptf("inode %d: bad ACL header", ino)
+	}
+	out := make([]byte, 4, len(b)*2)
+	le.PutUint32(out, posixACLXattrVersion)
+	for off := 4; off < len(b); {
+		if off+4 > len(b) {
+			return nil, corruptf("inode %d: truncated ACL entry", ino)
+		}
+		tag := le.Uint16(b[off:])
+		perm := le.Uint16(b[off+2:])
+		id := uint32(aclUndefinedID)
+		switch tag {
+		case aclUserObj, aclGroupObj, aclMask, aclOther:
+			off += 4
+		case aclUser, aclGroup:
+			if off+8 > len(b) {
+				return nil, corruptf("inode %d: truncated ACL entry", ino)
+			}
+			id = le.Uint32(b[off+4:])
+			off += 8
+		default:
+			return nil, corruptf("inode %d: bad ACL tag %#x", ino, tag)
+		}
+		var entry [8]byte
+		le.PutUint16(entry[0:], tag)
+		le.PutUint16(entry[2:], perm)
+		le.PutUint32(entry[4:], id)
+		out = append(out, entry[:]...)
+	}
+	return out, nil
+}
@@ -0,0 +1,289 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ext implements a read-only ext2, ext3 and ext4 filesystem backed by
+// a host file or block device holding a disk image.
+//
+// The on-disk format is parsed by package disklayout. File data is read into
+// the sentry page cache, which also backs memory mappings of files.
+//
+// Lock order:
+//
+//	inode.mapsMu
+//	  inode.dataMu
+//
+//	filesystem.inodesMu
+package ext
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/ext/disklayout"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+const (
+	// Name is the default filesystem name.
+	Name = "ext4"
+
+	defaultMaxCachedDentries = uint64(1000)
+)
+
+// FilesystemType implements vfs.FilesystemType.
+//
+// +stateify savable
+type FilesystemType struct{}
+
+// InternalData contains internal data passed in via
+// vfs.GetFilesystemOptions.InternalData.
+//
+// +stateify savable
+type InternalData struct {
+	// HostFD is a host file descriptor for the file or block device holding
+	// the filesystem image. The filesystem takes ownership of HostFD.
+	HostFD int
+
+	// UniqueID identifies the filesystem across save/restore, so that a new
+	// HostFD can be provided after restore; see CtxRestoreFDMap.
+	UniqueID string
+}
+
+// filesystem implements vfs.FilesystemImpl.
+//
+// +stateify savable
+type filesystem struct {
+	kernfs.Filesystem
+
+	devMinor uint32
+
+	// mfp is used to allocate memory that caches regular file contents. mfp
+	// is immutable.
+	mfp pgalloc.MemoryFileProvider
+
+	// uniqueID is InternalData.UniqueID. uniqueID is immutable.
+	uniqueID string
+
+	// hostFD is the host file descriptor for the filesystem image. hostFD is
+	// immutable, except that it's replaced by CompleteRestore.
+	hostFD int `state:"nosave"`
+
+	// vol reads the filesystem image through hostFD. vol is immutable, except
+	// that it's replaced by CompleteRestore.
+	vol *disklayout.Volume `state:"nosave"`
+
+	// uuid is the filesystem UUID, used to check that the image provided
+	// after restore is the one that was saved. uuid is immutable.
+	uuid [16]byte
+
+	// inodesMu protects inodes.
+	inodesMu sync.Mutex `state:"nosave"`
+
+	// inodes maps inode numbers to inodes that are in use, so that all hard
+	// links to a file share an inode and its page cache.
+	inodes map[uint32]*inode
+}
+
+// Name implements vfs.FilesystemType.Name.
+func (FilesystemType) Name() string {
+	return Name
+}
+
+// Release implements vfs.FilesystemType.Release.
+func (FilesystemType) Release(ctx context.Context) {}
+
+// GetFilesystem implements vfs.FilesystemType.GetFilesystem.
+func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, source string, opts vfs.GetFilesystemOptions) (*vfs.Filesystem, *vfs.Dentry, error) {
+	if opts.InternalData == nil {
+		ctx.Warningf("ext.FilesystemType.GetFilesystem: ext filesystems can only be mounted by the sandbox")
+		return nil, nil, linuxerr.EINVAL
+	}
+	data := opts.InternalData.(*InternalData)
+	// The filesystem owns data.HostFD from now on, so it must be closed if
+	// the mount fails.
+	closeFD := true
+	defer func() {
+		if closeFD {
+			unix.Close(data.HostFD)
+		}
+	}()
+
+	mopts := vfs.GenericParseMountOptions(opts.Data)
+	maxCachedDentries := defaultMaxCachedDentries
+	if str, ok := mopts["dentry_cache_limit"]; ok {
+		delete(mopts, "dentry_cache_limit")
+		var err error
+		maxCachedDentries, err = strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			ctx.Warningf("ext.FilesystemType.GetFilesystem: invalid dentry cache limit: dentry_cache_limit=%s", str)
+			return nil, nil, linuxerr.EINVAL
+		}
+	}
+	// Accept and ignore options that only affect writes or the journal.
+	for _, opt := range []string{"ro", "noload", "norecovery"} {
+		delete(mopts, opt)
+	}
+	if len(mopts) != 0 {
+		ctx.Warningf("ext.FilesystemType.GetFilesystem: unknown options: %v", mopts)
+		return nil, nil, linuxerr.EINVAL
+	}
+
+	mfp := pgalloc.MemoryFileProviderFromContext(ctx)
+	if mfp == nil {
+		ctx.Warningf("ext.FilesystemType.GetFilesystem: context does not provide a pgalloc.MemoryFileProvider")
+		return nil, nil, linuxerr.EINVAL
+	}
+
+	vol, err := disklayout.Open(hostFileReader{fd: data.HostFD})
+	if err != nil {
+		// Images that use features we can't read safely are refused outright,
+		// so log loudly enough for the operator to find out why.
+		ctx.Warningf("ext.FilesystemType.GetFilesystem: failed to mount %q: %v", source, err)
+		return nil, nil, linuxerr.EINVAL
+	}
+
+	devMinor, err := vfsObj.GetAnonBlockDevMinor()
+	if err != nil {
+		return nil, nil, err
+	}
+	fs := &filesystem{
+		devMinor: devMinor,
+		mfp:      mfp,
+		uniqueID: data.UniqueID,
+		hostFD:   data.HostFD,
+		vol:      vol,
+		uuid:     vol.SuperBlock().UUID,
+		inodes:   make(map[uint32]*inode),
+	}
+	closeFD = false
+	fs.MaxCachedDentries = maxCachedDentries
+	fs.VFSFilesystem().Init(vfsObj, &fsType, fs)
+
+	root, err := fs.getInode(disklayout.RootIno)
+	if err != nil {
+		ctx.Warningf("ext.FilesystemType.GetFilesystem: failed to read root directory of %q: %v", source, err)
+		fs.VFSFilesystem().DecRef(ctx)
+		return nil, nil, linuxerr.EINVAL
+	}
+	if !root.disk.IsDir() {
+		ctx.Warningf("ext.FilesystemType.GetFilesystem: root inode of %q is not a directory", source)
+		root.DecRef(ctx)
+		fs.VFSFilesystem().DecRef(ctx)
+		return nil, nil, linuxerr.EINVAL
+	}
+	var rootD kernfs.Dentry
+	rootD.InitRoot(&fs.Filesystem, root)
+	return fs.VFSFilesystem(), rootD.VFSDentry(), nil
+}
+
+// Release implements vfs.FilesystemImpl.Release.
+func (fs *filesystem) Release(ctx context.Context) {
+	fs.Filesystem.VFSFilesystem().VirtualFilesystem().PutAnonBlockDevMinor(fs.devMinor)
+	fs.Filesystem.Release(ctx)
+	if fs.hostFD >= 0 {
+		unix.Close(fs.hostFD)
+		fs.hostFD = -1
+	}
+}
+
+// MountOptions implements vfs.FilesystemImpl.MountOptions.
+func (fs *filesystem) MountOptions() string {
+	return fmt.Sprintf("ro,dentry_cache_limit=%d", fs.MaxCachedDentries)
+}
+
+// getInode returns the inode numbered ino, with a reference held by the
+// caller.
+func (fs *filesystem) getInode(ino uint32) (*inode, error) {
+	fs.inodesMu.Lock()
+	defer fs.inodesMu.Unlock()
+	if i, ok := fs.inodes[ino]; ok && i.TryIncRef() {
+		return i, nil
+	}
+	disk, err := fs.vol.ReadInode(ino)
+	if err != nil {
+		return nil, err
+	}
+	i := newInode(fs, disk)
+	fs.inodes[ino] = i
+	return i, nil
+}
+
+// forgetInode removes i from fs.inodes once its last reference is dropped.
+func (fs *filesystem) forgetInode(i *inode) {
+	fs.inodesMu.Lock()
+	defer fs.inodesMu.Unlock()
+	// A new inode may already have replaced i if getInode raced with the
+	// final DecRef.
+	if fs.inodes[i.disk.Num] == i {
+		delete(fs.inodes, i.disk.Num)
+	}
+}
+
+// hostFileReader implements io.ReaderAt for a host file descriptor.
+type hostFileReader struct {
+	fd int
+}
+
+// ReadAt implements io.ReaderAt.ReadAt.
+func (r hostFileReader) ReadAt(p []byte, off int64) (int, error) {
+	done := 0
+	for done < len(p) {
+		n, err := unix.Pread(r.fd, p[done:], off+int64(done))
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return done, err
+		}
+		if n == 0 {
+			break
+		}
+		done += n
+	}
+	return done, nil
+}
+
+// translateError converts an error returned by package disklayout to an
+// errno, logging errors that indicate a damaged image.
+func translateError(ctx context.Context, ino uint32, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, disklayout.ErrNotFound):
+		return linuxerr.ENOENT
+	case errors.Is(err, disklayout.ErrBadChecksum):
+		ctx.Warningf("ext: inode %d: %v", ino, err)
+		return linuxerr.EBADMSG
+	case errors.Is(err, disklayout.ErrCorrupted):
+		ctx.Warningf("ext: inode %d: %v", ino, err)
+		return linuxerr.EUCLEAN
+	case errors.Is(err, disklayout.ErrUnsupported):
+		ctx.Warningf("ext: inode %d: %v", ino, err)
+		return linuxerr.EOPNOTSUPP
+	}
+	var errno unix.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+	ctx.Warningf("ext: inode %d: %v", ino, err)
+	return linuxerr.EIO
+}
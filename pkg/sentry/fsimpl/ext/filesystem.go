@@ -0,0 +1,72 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// inodeAt returns the inode at rp, and a dentry holding a reference on it
+// that the caller must release.
+func (fs *filesystem) inodeAt(ctx context.Context, rp *vfs.ResolvingPath) (*inode, *vfs.Dentry, error) {
+	vd, err := fs.Filesystem.GetDentryAt(ctx, rp, vfs.GetDentryOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return vd.Impl().(*kernfs.Dentry).Inode().(*inode), vd, nil
+}
+
+// ListXattrAt implements vfs.FilesystemImpl.ListXattrAt.
+func (fs *filesystem) ListXattrAt(ctx context.Context, rp *vfs.ResolvingPath, size uint64) ([]string, error) {
+	i, vd, err := fs.inodeAt(ctx, rp)
+	if err != nil {
+		return nil, err
+	}
+	defer vd.DecRef(ctx)
+	return i.listXattr(ctx, rp.Credentials(), size)
+}
+
+// GetXattrAt implements vfs.FilesystemImpl.GetXattrAt.
+func (fs *filesystem) GetXattrAt(ctx context.Context, rp *vfs.ResolvingPath, opts vfs.GetXattrOptions) (string, error) {
+	i, vd, err := fs.inodeAt(ctx, rp)
+	if err != nil {
+		return "", err
+	}
+	defer vd.DecRef(ctx)
+	return i.getXattr(ctx, rp.Credentials(), &opts)
+}
+
+// SetXattrAt implements vfs.FilesystemImpl.SetXattrAt.
+func (fs *filesystem) SetXattrAt(ctx context.Context, rp *vfs.ResolvingPath, opts vfs.SetXattrOptions) error {
+	_, vd, err := fs.inodeAt(ctx, rp)
+	if err != nil {
+		return err
+	}
+	vd.DecRef(ctx)
+	return linuxerr.EROFS
+}
+
+// RemoveXattrAt implements vfs.FilesystemImpl.RemoveXattrAt.
+func (fs *filesystem) RemoveXattrAt(ctx context.Context, rp *vfs.ResolvingPath, name string) error {
+	_, vd, err := fs.inodeAt(ctx, rp)
+	if err != nil {
+		return err
+	}
+	vd.DecRef(ctx)
+	return linuxerr.EROFS
+}
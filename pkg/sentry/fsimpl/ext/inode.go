@@ -0,0 +1,411 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/ext/disklayout"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/pipe"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// inode implements kernfs.Inode for all file types.
+//
+// +stateify savable
+type inode struct {
+	inodeRefs
+	kernfs.InodeAlwaysValid
+	kernfs.InodeTemporary
+	kernfs.InodeWatches
+
+	// fs is the owning filesystem. fs is immutable.
+	fs *filesystem
+
+	// disk is the inode as read from the filesystem image. disk is
+	// immutable.
+	disk *disklayout.Inode
+
+	locks vfs.FileLocks
+
+	// children is always empty; it exists because kernfs.GenericDirectoryFD
+	// requires one. Directory entries are read from disk by IterDirents.
+	children kernfs.OrderedChildren
+
+	// direntsMu protects dirents.
+	direntsMu sync.Mutex `state:"nosave"`
+
+	// If this inode represents a directory, dirents caches its entries,
+	// excluding "." and "..", once they've been read by IterDirents. dirents
+	// is not saved since it can be read from disk again.
+	dirents []disklayout.Dirent `state:"nosave"`
+
+	// If this inode represents a named pipe, pipe implements it. pipe is
+	// immutable.
+	pipe *pipe.VFSPipe
+
+	// If this inode represents a regular file, mappings tracks mappings of the
+	// file into memmap.MappingSpaces. mappings is protected by mapsMu.
+	mapsMu   sync.Mutex `state:"nosave"`
+	mappings memmap.MappingSet
+
+	// If this inode represents a regular file, cache maps offsets into the
+	// file to offsets into fs.mfp.MemoryFile() that store the file's data.
+	// cache is protected by dataMu. Since the filesystem is read-only, cached
+	// pages are never dirty.
+	dataMu sync.RWMutex `state:"nosave"`
+	cache  fsutil.FileRangeSet
+}
+
+func newInode(fs *filesystem, disk *disklayout.Inode) *inode {
+	i := &inode{
+		fs:   fs,
+		disk: disk,
+	}
+	i.InitRefs()
+	switch {
+	case disk.IsDir():
+		i.children.Init(kernfs.OrderedChildrenOptions{})
+	case disk.FileType() == disklayout.ModeFIFO:
+		i.pipe = pipe.NewVFSPipe(true /* isNamed */, pipe.DefaultPipeSize)
+	}
+	return i
+}
+
+// DecRef implements kernfs.Inode.DecRef.
+func (i *inode) DecRef(ctx context.Context) {
+	i.inodeRefs.DecRef(func() {
+		i.fs.forgetInode(i)
+		if i.disk.IsRegular() {
+			mf := i.fs.mfp.MemoryFile()
+			i.dataMu.Lock()
+			mf.MarkAllUnevictable(i)
+			i.cache.DropAll(mf)
+			i.dataMu.Unlock()
+		}
+	})
+}
+
+// Mode implements kernfs.Inode.Mode.
+func (i *inode) Mode() linux.FileMode {
+	return linux.FileMode(i.disk.Mode)
+}
+
+func (i *inode) kuid() auth.KUID {
+	return auth.KUID(i.disk.UID)
+}
+
+func (i *inode) kgid() auth.KGID {
+	return auth.KGID(i.disk.GID)
+}
+
+// CheckPermissions implements kernfs.Inode.CheckPermissions.
+func (i *inode) CheckPermissions(ctx context.Context, creds *auth.Credentials, ats vfs.AccessTypes) error {
+	return vfs.GenericCheckPermissions(creds, ats, i.Mode(), i.kuid(), i.kgid())
+}
+
+func statxTimestamp(ts disklayout.Timestamp) linux.StatxTimestamp {
+	return linux.StatxTimestamp{Sec: ts.Sec, Nsec: ts.Nsec}
+}
+
+// Stat implements kernfs.Inode.Stat.
+func (i *inode) Stat(ctx context.Context, fs *vfs.Filesystem, opts vfs.StatOptions) (linux.Statx, error) {
+	d := i.disk
+	stat := linux.Statx{
+		Mask:     linux.STATX_BASIC_STATS,
+		Blksize:  uint32(i.fs.vol.BlockSize()),
+		Nlink:    uint32(d.LinksCount),
+		UID:      d.UID,
+		GID:      d.GID,
+		Mode:     d.Mode,
+		Ino:      uint64(d.Num),
+		Size:     d.Size,
+		Blocks:   d.Blocks,
+		Atime:    statxTimestamp(d.Atime),
+		Ctime:    statxTimestamp(d.Ctime),
+		Mtime:    statxTimestamp(d.Mtime),
+		DevMajor: linux.UNNAMED_MAJOR,
+		DevMinor: i.fs.devMinor,
+	}
+	if d.HasCrtime {
+		stat.Mask |= linux.STATX_BTIME
+		stat.Btime = statxTimestamp(d.Crtime)
+	}
+	if ft := d.FileType(); ft == disklayout.ModeCharDev || ft == disklayout.ModeBlockDev {
+		stat.RdevMajor, stat.RdevMinor = d.DeviceNumber()
+	}
+	return stat, nil
+}
+
+// SetStat implements kernfs.Inode.SetStat.
+func (i *inode) SetStat(ctx context.Context, fs *vfs.Filesystem, creds *auth.Credentials, opts vfs.SetStatOptions) error {
+	if opts.Stat.Mask == 0 {
+		return nil
+	}
+	return linuxerr.EROFS
+}
+
+// HasChildren implements kernfs.Inode.HasChildren.
+func (i *inode) HasChildren() bool {
+	return i.disk.IsDir()
+}
+
+// NewFile implements kernfs.Inode.NewFile.
+func (i *inode) NewFile(context.Context, string, vfs.OpenOptions) (kernfs.Inode, error) {
+	return nil, linuxerr.EROFS
+}
+
+// NewDir implements kernfs.Inode.NewDir.
+func (i *inode) NewDir(context.Context, string, vfs.MkdirOptions) (kernfs.Inode, error) {
+	return nil, linuxerr.EROFS
+}
+
+// NewLink implements kernfs.Inode.NewLink.
+func (i *inode) NewLink(context.Context, string, kernfs.Inode) (kernfs.Inode, error) {
+	return nil, linuxerr.EROFS
+}
+
+// NewSymlink implements kernfs.Inode.NewSymlink.
+func (i *inode) NewSymlink(context.Context, string, string) (kernfs.Inode, error) {
+	return nil, linuxerr.EROFS
+}
+
+// NewNode implements kernfs.Inode.NewNode.
+func (i *inode) NewNode(context.Context, string, vfs.MknodOptions) (kernfs.Inode, error) {
+	return nil, linuxerr.EROFS
+}
+
+// Unlink implements kernfs.Inode.Unlink.
+func (i *inode) Unlink(context.Context, string, kernfs.Inode) error {
+	return linuxerr.EROFS
+}
+
+// RmDir implements kernfs.Inode.RmDir.
+func (i *inode) RmDir(context.Context, string, kernfs.Inode) error {
+	return linuxerr.EROFS
+}
+
+// Rename implements kernfs.Inode.Rename.
+func (i *inode) Rename(context.Context, string, string, kernfs.Inode, kernfs.Inode) error {
+	return linuxerr.EROFS
+}
+
+// Lookup implements kernfs.Inode.Lookup.
+func (i *inode) Lookup(ctx context.Context, name string) (kernfs.Inode, error) {
+	if !i.disk.IsDir() {
+		return nil, linuxerr.ENOTDIR
+	}
+	dirent, err := i.fs.vol.Lookup(i.disk, name)
+	if err != nil {
+		return nil, translateError(ctx, i.disk.Num, err)
+	}
+	child, err := i.fs.getInode(dirent.Inode)
+	if err != nil {
+		return nil, translateError(ctx, dirent.Inode, err)
+	}
+	return child, nil
+}
+
+// direntType returns the linux.DT_* type corresponding to the given
+// disklayout.FileType*.
+func direntType(ft uint8) uint8 {
+	switch ft {
+	case disklayout.FileTypeRegular:
+		return linux.DT_REG
+	case disklayout.FileTypeDir:
+		return linux.DT_DIR
+	case disklayout.FileTypeCharDev:
+		return linux.DT_CHR
+	case disklayout.FileTypeBlockDev:
+		return linux.DT_BLK
+	case disklayout.FileTypeFIFO:
+		return linux.DT_FIFO
+	case disklayout.FileTypeSocket:
+		return linux.DT_SOCK
+	case disklayout.FileTypeSymlink:
+		return linux.DT_LNK
+	default:
+		return linux.DT_UNKNOWN
+	}
+}
+
+// getDirents returns the entries of the directory represented by i,
+// excluding "." and "..".
+func (i *inode) getDirents(ctx context.Context) ([]disklayout.Dirent, error) {
+	i.direntsMu.Lock()
+	defer i.direntsMu.Unlock()
+	if i.dirents != nil {
+		return i.dirents, nil
+	}
+	dirents := []disklayout.Dirent{}
+	err := i.fs.vol.ReadDir(i.disk, func(d disklayout.Dirent) bool {
+		if d.Name != "." && d.Name != ".." {
+			dirents = append(dirents, d)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, translateError(ctx, i.disk.Num, err)
+	}
+	i.dirents = dirents
+	return dirents, nil
+}
+
+// IterDirents implements kernfs.Inode.IterDirents.
+func (i *inode) IterDirents(ctx context.Context, mnt *vfs.Mount, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+	if !i.disk.IsDir() {
+		return offset, linuxerr.ENOTDIR
+	}
+	dirents, err := i.getDirents(ctx)
+	if err != nil {
+		return offset, err
+	}
+	for idx := relOffset; idx < int64(len(dirents)); idx++ {
+		d := dirents[idx]
+		dirent := vfs.Dirent{
+			Name:    d.Name,
+			Type:    direntType(d.Type),
+			Ino:     uint64(d.Inode),
+			NextOff: offset + 1,
+		}
+		if err := cb.Handle(dirent); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
+
+// Readlink implements kernfs.Inode.Readlink.
+func (i *inode) Readlink(ctx context.Context, mnt *vfs.Mount) (string, error) {
+	if !i.disk.IsSymlink() {
+		return "", linuxerr.EINVAL
+	}
+	target, err := i.fs.vol.Readlink(i.disk)
+	if err != nil {
+		return "", translateError(ctx, i.disk.Num, err)
+	}
+	return target, nil
+}
+
+// Getlink implements kernfs.Inode.Getlink.
+func (i *inode) Getlink(ctx context.Context, mnt *vfs.Mount) (vfs.VirtualDentry, string, error) {
+	target, err := i.Readlink(ctx, mnt)
+	return vfs.VirtualDentry{}, target, err
+}
+
+// Open implements kernfs.Inode.Open.
+func (i *inode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	switch i.disk.FileType() {
+	case disklayout.ModeDirectory:
+		return newDirectoryFD(rp.Mount(), d, i, &opts)
+	case disklayout.ModeRegular:
+		return newRegularFileFD(rp.Mount(), d, i, &opts)
+	case disklayout.ModeSymlink:
+		// Can't open symlinks without O_PATH, which is handled at the VFS
+		// layer.
+		return nil, linuxerr.ELOOP
+	case disklayout.ModeFIFO:
+		return i.pipe.Open(ctx, rp.Mount(), d.VFSDentry(), opts.Flags, &i.locks)
+	case disklayout.ModeCharDev:
+		major, minor := i.disk.DeviceNumber()
+		return rp.VirtualFilesystem().OpenDeviceSpecialFile(ctx, rp.Mount(), d.VFSDentry(), vfs.CharDevice, major, minor, &opts)
+	case disklayout.ModeBlockDev:
+		major, minor := i.disk.DeviceNumber()
+		return rp.VirtualFilesystem().OpenDeviceSpecialFile(ctx, rp.Mount(), d.VFSDentry(), vfs.BlockDevice, major, minor, &opts)
+	default:
+		// Sockets can't be opened, and there's nothing bound to them anyway.
+		return nil, linuxerr.ENXIO
+	}
+}
+
+// StatFS implements kernfs.Inode.StatFS.
+func (i *inode) StatFS(ctx context.Context, fs *vfs.Filesystem) (linux.Statfs, error) {
+	sb := i.fs.vol.SuperBlock()
+	// Compare fs/ext4/super.c:ext4_statfs().
+	var fsid uint64
+	for b := 0; b < 8; b++ {
+		fsid |= uint64(sb.UUID[b]^sb.UUID[b+8]) << (8 * b)
+	}
+	return linux.Statfs{
+		Type:            linux.EXT_SUPER_MAGIC,
+		BlockSize:       int64(sb.BlockSize),
+		Blocks:          sb.BlocksCount,
+		BlocksFree:      sb.FreeBlocksCount,
+		BlocksAvailable: sb.FreeBlocksCount,
+		Files:           uint64(sb.InodesCount),
+		FilesFree:       uint64(sb.FreeInodesCount),
+		FSID:            [2]int32{int32(uint32(fsid)), int32(uint32(fsid >> 32))},
+		NameLength:      disklayout.MaxNameLen,
+		FragmentSize:    int64(sb.BlockSize),
+	}, nil
+}
+
+// listXattr implements vfs.FileDescriptionImpl.ListXattr for all file types.
+func (i *inode) listXattr(ctx context.Context, creds *auth.Credentials, size uint64) ([]string, error) {
+	xattrs, err := i.fs.vol.Xattrs(i.disk)
+	if err != nil {
+		return nil, translateError(ctx, i.disk.Num, err)
+	}
+	haveCap := creds.HasCapability(linux.CAP_SYS_ADMIN)
+	names := make([]string, 0, len(xattrs))
+	listSize := 0
+	for _, x := range xattrs {
+		// Hide extended attributes in the "trusted" namespace from
+		// non-privileged users, as does Linux's
+		// fs/ext4/xattr_trusted.c:ext4_xattr_trusted_list().
+		if !haveCap && strings.HasPrefix(x.Name, linux.XATTR_TRUSTED_PREFIX) {
+			continue
+		}
+		names = append(names, x.Name)
+		// Add one byte per null terminator.
+		listSize += len(x.Name) + 1
+	}
+	if size != 0 && uint64(listSize) > size {
+		return nil, linuxerr.ERANGE
+	}
+	return names, nil
+}
+
+// getXattr implements vfs.FileDescriptionImpl.GetXattr for all file types.
+func (i *inode) getXattr(ctx context.Context, creds *auth.Credentials, opts *vfs.GetXattrOptions) (string, error) {
+	if err := vfs.CheckXattrPermissions(creds, vfs.MayRead, i.Mode(), i.kuid(), opts.Name); err != nil {
+		return "", err
+	}
+	xattrs, err := i.fs.vol.Xattrs(i.disk)
+	if err != nil {
+		return "", translateError(ctx, i.disk.Num, err)
+	}
+	for _, x := range xattrs {
+		if x.Name != opts.Name {
+			continue
+		}
+		// Check that the size of the buffer provided in getxattr(2) is large
+		// enough to contain the value.
+		if opts.Size != 0 && uint64(len(x.Value)) > opts.Size {
+			return "", linuxerr.ERANGE
+		}
+		return string(x.Value), nil
+	}
+	return "", linuxerr.ENODATA
+}
@@ -0,0 +1,482 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"io"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/hostfd"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// regularFileFD implements vfs.FileDescriptionImpl for regular files.
+//
+// +stateify savable
+type regularFileFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.LockFD
+
+	// offMu protects off.
+	offMu sync.Mutex `state:"nosave"`
+
+	// off is the file offset.
+	off int64
+}
+
+func newRegularFileFD(mnt *vfs.Mount, d *kernfs.Dentry, i *inode, opts *vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &regularFileFD{}
+	fd.LockFD.Init(&i.locks)
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, d.VFSDentry(), &vfs.FileDescriptionOptions{
+		AllowDirectIO: true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+func (fd *regularFileFD) inode() *inode {
+	return fd.vfsfd.Dentry().Impl().(*kernfs.Dentry).Inode().(*inode)
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *regularFileFD) Release(context.Context) {}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *regularFileFD) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
+	return fd.inode().Stat(ctx, fd.vfsfd.Mount().Filesystem(), opts)
+}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *regularFileFD) SetStat(ctx context.Context, opts vfs.SetStatOptions) error {
+	return fd.inode().SetStat(ctx, fd.vfsfd.Mount().Filesystem(), auth.CredentialsFromContext(ctx), opts)
+}
+
+// StatFS implements vfs.FileDescriptionImpl.StatFS.
+func (fd *regularFileFD) StatFS(ctx context.Context) (linux.Statfs, error) {
+	return fd.inode().StatFS(ctx, fd.vfsfd.Mount().Filesystem())
+}
+
+// ListXattr implements vfs.FileDescriptionImpl.ListXattr.
+func (fd *regularFileFD) ListXattr(ctx context.Context, size uint64) ([]string, error) {
+	return fd.inode().listXattr(ctx, auth.CredentialsFromContext(ctx), size)
+}
+
+// GetXattr implements vfs.FileDescriptionImpl.GetXattr.
+func (fd *regularFileFD) GetXattr(ctx context.Context, opts vfs.GetXattrOptions) (string, error) {
+	return fd.inode().getXattr(ctx, auth.CredentialsFromContext(ctx), &opts)
+}
+
+// SetXattr implements vfs.FileDescriptionImpl.SetXattr.
+func (fd *regularFileFD) SetXattr(ctx context.Context, opts vfs.SetXattrOptions) error {
+	return linuxerr.EROFS
+}
+
+// RemoveXattr implements vfs.FileDescriptionImpl.RemoveXattr.
+func (fd *regularFileFD) RemoveXattr(ctx context.Context, name string) error {
+	return linuxerr.EROFS
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+
+	// Check that flags are supported.
+	//
+	// TODO(gvisor.dev/issue/2601): Support select preadv2 flags.
+	if opts.Flags&^linux.RWF_HIPRI != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+
+	i := fd.inode()
+	if uint64(offset) >= i.disk.Size {
+		return 0, io.EOF
+	}
+	rw := inodeReader{
+		ctx:    ctx,
+		i:      i,
+		off:    uint64(offset),
+		direct: fd.vfsfd.StatusFlags()&linux.O_DIRECT != 0,
+	}
+	return dst.CopyOutFrom(ctx, &rw)
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *regularFileFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	fd.offMu.Lock()
+	n, err := fd.PRead(ctx, dst, fd.off, opts)
+	fd.off += n
+	fd.offMu.Unlock()
+	return n, err
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (fd *regularFileFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	return 0, linuxerr.EROFS
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *regularFileFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	return 0, linuxerr.EROFS
+}
+
+// Seek implements vfs.FileDescriptionImpl.Seek.
+func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	fd.offMu.Lock()
+	defer fd.offMu.Unlock()
+	i := fd.inode()
+	size := int64(i.disk.Size)
+	switch whence {
+	case linux.SEEK_SET:
+		// Use offset as specified.
+	case linux.SEEK_CUR:
+		offset += fd.off
+	case linux.SEEK_END:
+		offset += size
+	case linux.SEEK_DATA, linux.SEEK_HOLE:
+		if offset < 0 || offset >= size {
+			return 0, linuxerr.ENXIO
+		}
+		var err error
+		offset, err = i.seekHoleOrData(ctx, offset, whence == linux.SEEK_DATA)
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	fd.off = offset
+	return offset, nil
+}
+
+// seekHoleOrData returns the offset of the first byte at or after offset that
+// is in a hole (if !data) or not in a hole (if data). The end of the file is
+// considered to be a hole.
+//
+// Preconditions: 0 <= offset < i.disk.Size.
+func (i *inode) seekHoleOrData(ctx context.Context, offset int64, data bool) (int64, error) {
+	bs := i.fs.vol.BlockSize()
+	pos := uint64(offset)
+	for pos < i.disk.Size {
+		m, err := i.fs.vol.MapBlock(i.disk, pos/bs)
+		if err != nil {
+			return 0, translateError(ctx, i.disk.Num, err)
+		}
+		if (m.Physical != 0) == data {
+			return int64(pos), nil
+		}
+		pos = (pos/bs + m.Length) * bs
+	}
+	if data {
+		return 0, linuxerr.ENXIO
+	}
+	return int64(i.disk.Size), nil
+}
+
+// Sync implements vfs.FileDescriptionImpl.Sync.
+func (fd *regularFileFD) Sync(ctx context.Context) error {
+	return nil
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
+func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	return vfs.GenericConfigureMMap(&fd.vfsfd, fd.inode(), opts)
+}
+
+// inodeReader implements safemem.Reader for the contents of a regular file.
+type inodeReader struct {
+	ctx context.Context
+	i   *inode
+	off uint64
+
+	// If direct is true, reads bypass the page cache.
+	direct bool
+}
+
+// ReadToBlocks implements safemem.Reader.ReadToBlocks.
+func (rw *inodeReader) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error) {
+	if dsts.IsEmpty() {
+		return 0, nil
+	}
+	i := rw.i
+
+	// Compute the range to read (limited by file size and overflow-checked).
+	end := i.disk.Size
+	if rw.off >= end {
+		return 0, io.EOF
+	}
+	if rend := rw.off + dsts.NumBytes(); rend > rw.off && rend < end {
+		end = rend
+	}
+
+	mf := i.fs.mfp.MemoryFile()
+	if rw.direct || !mf.ShouldCacheEvictable() {
+		// Read directly from the image.
+		n, err := i.readAt(rw.ctx, dsts.TakeFirst64(end-rw.off), rw.off)
+		rw.off += n
+		return n, err
+	}
+
+	// Otherwise read through the cache.
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+	var done uint64
+	seg, gap := i.cache.Find(rw.off)
+	for rw.off < end {
+		mr := memmap.MappableRange{rw.off, end}
+		switch {
+		case seg.Ok():
+			// Get internal mappings from the cache.
+			ims, err := mf.MapInternal(seg.FileRangeOf(seg.Range().Intersect(mr)), hostarch.Read)
+			if err != nil {
+				return done, err
+			}
+
+			// Copy from internal mappings.
+			n, err := safemem.CopySeq(dsts, ims)
+			done += n
+			rw.off += n
+			dsts = dsts.DropFirst64(n)
+			if err != nil {
+				return done, err
+			}
+
+			// Continue.
+			seg, gap = seg.NextNonEmpty()
+
+		case gap.Ok():
+			// Read into the cache, then re-enter the loop to read from the
+			// cache.
+			gapMR := gap.Range().Intersect(mr)
+			gapEnd, _ := hostarch.PageRoundUp(gapMR.End)
+			reqMR := memmap.MappableRange{
+				Start: hostarch.PageRoundDown(gapMR.Start),
+				End:   gapEnd,
+			}
+			optMR := gap.Range()
+			_, err := i.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR), i.disk.Size, mf, usage.PageCache, true /* populate */, i.readAt)
+			mf.MarkEvictable(i, pgalloc.EvictableRange{optMR.Start, optMR.End})
+			seg, gap = i.cache.Find(rw.off)
+			if !seg.Ok() {
+				return done, err
+			}
+			// err might have occurred in part of gap.Range() outside gapMR
+			// (in particular, gap.End() might be beyond EOF). Forget about
+			// it for now; if the error matters and persists, we'll run into
+			// it again in a later iteration of this loop.
+		}
+	}
+	return done, nil
+}
+
+// readAt reads the file's data at offset into dsts from the filesystem image.
+// Holes read as zeros. It is also used to fill the page cache.
+func (i *inode) readAt(ctx context.Context, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+	vol := i.fs.vol
+	bs := vol.BlockSize()
+	var done uint64
+	for !dsts.IsEmpty() {
+		pos := offset + done
+		if pos >= i.disk.Size {
+			return done, io.EOF
+		}
+		m, err := vol.MapBlock(i.disk, pos/bs)
+		if err != nil {
+			return done, translateError(ctx, i.disk.Num, err)
+		}
+		n := m.Length*bs - pos%bs
+		if rem := i.disk.Size - pos; n > rem {
+			n = rem
+		}
+		seg := dsts.TakeFirst64(n)
+		var cp uint64
+		if m.Physical == 0 {
+			cp, err = safemem.ZeroSeq(seg)
+		} else {
+			// MapBlock has checked that the mapping is within the
+			// filesystem, so this doesn't overflow.
+			cp, err = hostfd.Preadv2(int32(i.fs.hostFD), seg, int64(m.Physical*bs+pos%bs), 0)
+			if err == io.EOF {
+				// The device is smaller than the filesystem claims.
+				log.Warningf("ext: inode %d: read of block %d is past the end of the device", i.disk.Num, m.Physical)
+				err = linuxerr.EIO
+			}
+		}
+		done += cp
+		dsts = dsts.DropFirst64(cp)
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+func maxFillRange(required, optional memmap.MappableRange) memmap.MappableRange {
+	const maxReadahead = 64 << 10 // 64 KB, chosen arbitrarily
+	if required.Length() >= maxReadahead {
+		return required
+	}
+	if optional.Length() <= maxReadahead {
+		return optional
+	}
+	optional.Start = required.Start
+	if optional.Length() <= maxReadahead {
+		return optional
+	}
+	optional.End = optional.Start + maxReadahead
+	return optional
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (i *inode) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	i.mapsMu.Lock()
+	mapped := i.mappings.AddMapping(ms, ar, offset, writable)
+	// i.Evict() will refuse to evict memory-mapped pages, so tell the
+	// MemoryFile to not bother trying.
+	mf := i.fs.mfp.MemoryFile()
+	for _, r := range mapped {
+		mf.MarkUnevictable(i, pgalloc.EvictableRange{r.Start, r.End})
+	}
+	i.mapsMu.Unlock()
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (i *inode) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+	i.mapsMu.Lock()
+	unmapped := i.mappings.RemoveMapping(ms, ar, offset, writable)
+	// Pages that are no longer referenced by any application memory mappings
+	// are now considered unused; allow MemoryFile to evict them when
+	// necessary.
+	mf := i.fs.mfp.MemoryFile()
+	i.dataMu.Lock()
+	for _, r := range unmapped {
+		mf.MarkEvictable(i, pgalloc.EvictableRange{r.Start, r.End})
+	}
+	i.dataMu.Unlock()
+	i.mapsMu.Unlock()
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (i *inode) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	return i.AddMapping(ctx, ms, dstAR, offset, writable)
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (i *inode) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	if at.Write {
+		// Shared writable mappings require a writable file description;
+		// private mappings are copied on write by the MM, which translates
+		// them for reading.
+		return nil, &memmap.BusError{linuxerr.EROFS}
+	}
+
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+
+	// Constrain translations to the file size (rounded up).
+	pgend, _ := hostarch.PageRoundUp(i.disk.Size)
+	var beyondEOF bool
+	if required.End > pgend {
+		if required.Start >= pgend {
+			return nil, &memmap.BusError{io.EOF}
+		}
+		beyondEOF = true
+		required.End = pgend
+	}
+	if optional.End > pgend {
+		optional.End = pgend
+	}
+
+	mf := i.fs.mfp.MemoryFile()
+	_, cerr := i.cache.Fill(ctx, required, maxFillRange(required, optional), i.disk.Size, mf, usage.PageCache, true /* populate */, i.readAt)
+
+	var ts []memmap.Translation
+	var translatedEnd uint64
+	for seg := i.cache.FindSegment(required.Start); seg.Ok() && seg.Start() < required.End; seg, _ = seg.NextNonEmpty() {
+		segMR := seg.Range().Intersect(optional)
+		ts = append(ts, memmap.Translation{
+			Source: segMR,
+			File:   mf,
+			Offset: seg.FileRangeOf(segMR).Start,
+			Perms:  hostarch.ReadExecute,
+		})
+		translatedEnd = segMR.End
+	}
+
+	// Don't return the error returned by i.cache.Fill if it occurred outside
+	// of required.
+	if translatedEnd < required.End && cerr != nil {
+		return ts, &memmap.BusError{cerr}
+	}
+	if beyondEOF {
+		return ts, &memmap.BusError{io.EOF}
+	}
+	return ts, nil
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (i *inode) InvalidateUnsavable(ctx context.Context) error {
+	i.mapsMu.Lock()
+	defer i.mapsMu.Unlock()
+	i.mappings.InvalidateAll(memmap.InvalidateOpts{})
+
+	// Discard the cache so that it's not stored in saved state. Cached pages
+	// are never dirty, so they can be read from the image again after
+	// restore.
+	mf := i.fs.mfp.MemoryFile()
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+	mf.MarkAllUnevictable(i)
+	i.cache.DropAll(mf)
+	return nil
+}
+
+// Evict implements pgalloc.EvictableMemoryUser.Evict.
+func (i *inode) Evict(ctx context.Context, er pgalloc.EvictableRange) {
+	mr := memmap.MappableRange{er.Start, er.End}
+	mf := i.fs.mfp.MemoryFile()
+	i.mapsMu.Lock()
+	defer i.mapsMu.Unlock()
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+
+	// Only allow pages that are no longer memory-mapped to be evicted.
+	for mgap := i.mappings.LowerBoundGap(mr.Start); mgap.Ok() && mgap.Start() < mr.End; mgap = mgap.NextGap() {
+		mgapMR := mgap.Range().Intersect(mr)
+		if mgapMR.Length() == 0 {
+			continue
+		}
+		i.cache.Drop(mgapMR, mf)
+	}
+}
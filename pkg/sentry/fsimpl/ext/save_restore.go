@@ -0,0 +1,64 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ext
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/ext/disklayout"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+type saveRestoreContextID int
+
+const (
+	// CtxRestoreFDMap is a Context.Value key for a map[string]int mapping
+	// filesystem unique IDs (cf. InternalData.UniqueID) to host FDs for the
+	// filesystem images.
+	CtxRestoreFDMap saveRestoreContextID = iota
+)
+
+// PrepareSave implements vfs.FilesystemImplSaveRestoreExtension.PrepareSave.
+func (fs *filesystem) PrepareSave(ctx context.Context) error {
+	if len(fs.uniqueID) == 0 {
+		return fmt.Errorf("ext.filesystem with no UniqueID cannot be saved")
+	}
+	return nil
+}
+
+// CompleteRestore implements
+// vfs.FilesystemImplSaveRestoreExtension.CompleteRestore.
+func (fs *filesystem) CompleteRestore(ctx context.Context, opts vfs.CompleteRestoreOptions) error {
+	fdmapv := ctx.Value(CtxRestoreFDMap)
+	if fdmapv == nil {
+		return fmt.Errorf("no ext image FD map available")
+	}
+	fd, ok := fdmapv.(map[string]int)[fs.uniqueID]
+	if !ok {
+		return fmt.Errorf("no image FD available for ext filesystem with unique ID %q", fs.uniqueID)
+	}
+	vol, err := disklayout.Open(hostFileReader{fd: fd})
+	if err != nil {
+		return vfs.ErrCorruption{fmt.Errorf("failed to open ext filesystem with unique ID %q: %w", fs.uniqueID, err)}
+	}
+	// Inodes are saved, so the image must not have changed.
+	if vol.SuperBlock().UUID != fs.uuid {
+		return vfs.ErrCorruption{fmt.Errorf("ext filesystem with unique ID %q has UUID %x, want %x", fs.uniqueID, vol.SuperBlock().UUID, fs.uuid)}
+	}
+	fs.hostFD = fd
+	fs.vol = vol
+	return nil
+}
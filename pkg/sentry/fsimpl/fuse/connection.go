@@ -23,6 +23,7 @@ import (
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
 
@@ -60,7 +61,8 @@ type connection struct {
 	//	- FUSE_EXPORT_SUPPORT
 	//	- FUSE_POSIX_LOCKS: requires POSIX locks
 	//	- FUSE_FLOCK_LOCKS: requires POSIX locks
-	//	- FUSE_AUTO_INVAL_DATA: requires page caching eviction
+	//	- FUSE_AUTO_INVAL_DATA: requires invalidating the page cache on mtime changes
+	//	- FUSE_WRITEBACK_CACHE: writes are always write-through
 	//	- FUSE_DO_READDIRPLUS/FUSE_READDIRPLUS_AUTO: requires FUSE_READDIRPLUS implementation
 	//	- FUSE_ASYNC_DIO
 	//	- FUSE_PARALLEL_DIROPS (7.25)
@@ -69,7 +71,7 @@ type connection struct {
 	//	- FUSE_ABORT_ERROR (7.27)
 	//	- FUSE_CACHE_SYMLINKS (7.28)
 	//	- FUSE_NO_OPENDIR_SUPPORT (7.29)
-	//	- FUSE_EXPLICIT_INVAL_DATA: requires page caching eviction (7.30)
+	//	- FUSE_EXPLICIT_INVAL_DATA: requires FUSE_NOTIFY_INVAL_INODE (7.30)
 	//	- FUSE_MAP_ALIGNMENT (7.31)
 
 	// initialized after receiving FUSE_INIT reply.
@@ -99,11 +101,15 @@ type connection struct {
 	// +checklocks:mu
 	connInitSuccess bool
 
-	// aborted via sysfs, and will send ECONNABORTED to read after disconnection (instead of ENODEV).
-	// Set only if abortErr is true and via fuse control fs (not yet implemented).
-	// TODO(gvisor.dev/issue/3525): set this to true when user aborts.
+	// aborted is true if the connection was aborted through fusectl.
+	// +checklocks:mu
 	aborted bool
 
+	// noInterrupt is true if the FUSE server replied to a FUSE_INTERRUPT
+	// request with ENOSYS, after which no more are sent to it.
+	// +checklocks:mu
+	noInterrupt bool
+
 	// numWaiting is the number of requests waiting to be
 	// sent to FUSE device or being processed by FUSE daemon.
 	numWaiting uint32
@@ -169,7 +175,7 @@ type connection struct {
 
 	// writebackCache is true for write-back cache policy,
 	// false for write-through policy.
-	// Negotiated and only set in INIT.
+	// Only write-through is supported, so this is always false.
 	writebackCache bool
 
 	// bigWrites if doing multi-page cached writes.
@@ -183,6 +189,17 @@ type connection struct {
 	// noOpen if FUSE server doesn't support open operation.
 	// This flag only influence performance, not correctness of the program.
 	noOpen bool
+
+	// ctlID is the name of the connection's directory in fusectl, which is
+	// the device minor number of the filesystem that created the connection.
+	// ctlUID and ctlGID own the directory. They are immutable.
+	ctlID  uint32
+	ctlUID auth.KUID
+	ctlGID auth.KGID
+
+	// ctlListed is true if the connection is listed in fusectl. It is
+	// protected by controlConns.mu.
+	ctlListed bool
 }
 
 func (conn *connection) saveInitializedChan() bool {
@@ -284,7 +301,7 @@ func (conn *connection) Call(t *kernel.Task, r *Request) (*Response, error) {
 		return nil, err
 	}
 
-	return fut.resolve(t)
+	return fut.resolve(t, conn)
 }
 
 // callFuture makes a request to the server and returns a future response.
@@ -339,3 +356,43 @@ func (conn *connection) callFutureLocked(t *kernel.Task, r *Request) (*futureRes
 
 	return fut, nil
 }
+
+// interrupt is called when a task waiting for the response to the request with
+// the given unique ID is interrupted. If the server hasn't read the request
+// yet, it is cancelled and interrupt returns false. Otherwise, the server is
+// sent a FUSE_INTERRUPT request, unless it doesn't support them, and interrupt
+// returns true; the caller must then keep waiting for the response.
+func (conn *connection) interrupt(unique linux.FUSEOpID) bool {
+	conn.fd.mu.Lock()
+	defer conn.fd.mu.Unlock()
+
+	for r := conn.fd.queue.Front(); r != nil; r = r.Next() {
+		if r.id != unique {
+			continue
+		}
+		conn.fd.queue.Remove(r)
+		delete(conn.fd.completions, unique)
+		conn.fd.numActiveRequests--
+		// Signal any task waiting for room in the queue.
+		select {
+		case conn.fd.fullQueueCh <- struct{}{}:
+		default:
+		}
+		return false
+	}
+
+	// Either the server is processing the request, or it is in the middle of
+	// writing the response (or has just written it), in which case the
+	// response is all that's left to wait for.
+	if _, ok := conn.fd.completions[unique]; ok {
+		conn.mu.Lock()
+		send := conn.connected && !conn.noInterrupt
+		conn.mu.Unlock()
+		if send {
+			// As in Linux, interrupts take priority over other requests.
+			conn.fd.queue.PushFront(newInterruptRequest(unique))
+			conn.fd.waitQueue.Notify(waiter.ReadableEvents)
+		}
+	}
+	return true
+}
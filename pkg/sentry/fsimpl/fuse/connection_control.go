@@ -140,7 +140,12 @@ func (conn *connection) initProcessReply(out *linux.FUSEInitOut, hasSysAdminCap
 		conn.asyncRead = out.Flags&linux.FUSE_ASYNC_READ != 0
 		conn.bigWrites = out.Flags&linux.FUSE_BIG_WRITES != 0
 		conn.dontMask = out.Flags&linux.FUSE_DONT_MASK != 0
-		conn.writebackCache = out.Flags&linux.FUSE_WRITEBACK_CACHE != 0
+		// FUSE_WRITEBACK_CACHE is never requested, since writes are always
+		// sent to the server synchronously (see inode.writeCache). A server
+		// that sets it regardless would expect the kernel to be the
+		// authority on file size and mtime, which this implementation isn't,
+		// so it's ignored.
+		conn.writebackCache = false
 
 		// TODO(gvisor.dev/issue/3195): figure out how to use TimeGran (0 < TimeGran <= fuseMaxTimeGranNs).
 
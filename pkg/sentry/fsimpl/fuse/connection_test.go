@@ -19,10 +19,13 @@ import (
 	"testing"
 
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
 )
 
 // TestConnectionInitBlock tests if initialization
@@ -110,3 +113,102 @@ func TestConnectionAbort(t *testing.T) {
 	}
 
 }
+
+func TestConnectionInterrupt(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	k := kernel.KernelFromContext(s.Ctx)
+	creds := auth.CredentialsFromContext(s.Ctx)
+	task := kernel.TaskFromContext(s.Ctx)
+
+	conn, _, err := newTestConnection(s, k, maxActiveRequestsDefault)
+	if err != nil {
+		t.Fatalf("newTestConnection: %v", err)
+	}
+	fd := conn.fd
+	testObj := primitive.Uint32(rand.Uint32())
+	buf := make([]byte, linux.FUSE_MIN_READ_BUFFER)
+	hdrLen := uint32((*linux.FUSEHeaderOut)(nil).SizeBytes())
+	reply := func(unique linux.FUSEOpID, errno int32) {
+		t.Helper()
+		hdr := linux.FUSEHeaderOut{Len: hdrLen, Error: errno, Unique: unique}
+		b := make([]byte, hdrLen)
+		hdr.MarshalBytes(b)
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		if _, err := fd.writeLocked(s.Ctx, usermem.BytesIOSequence(b), vfs.WriteOptions{}); err != nil {
+			t.Fatalf("writeLocked: %v", err)
+		}
+	}
+	read := func() *Request {
+		t.Helper()
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		req := fd.queue.Front()
+		if _, err := fd.readLocked(s.Ctx, usermem.BytesIOSequence(buf), vfs.ReadOptions{}); err != nil {
+			t.Fatalf("readLocked: %v", err)
+		}
+		return req
+	}
+
+	// A request that the server hasn't read yet is cancelled.
+	req := conn.NewRequest(creds, 0, 0, 0, &testObj)
+	fd.mu.Lock()
+	if _, err := conn.callFutureLocked(task, req); err != nil {
+		t.Fatalf("callFutureLocked failed: %v", err)
+	}
+	fd.mu.Unlock()
+	if conn.interrupt(req.id) {
+		t.Errorf("interrupt of unread request returned true")
+	}
+	fd.mu.Lock()
+	if !fd.queue.Empty() || len(fd.completions) != 0 || fd.numActiveRequests != 0 {
+		t.Errorf("unread request not cancelled: queue empty %t, %d completions, %d active requests", fd.queue.Empty(), len(fd.completions), fd.numActiveRequests)
+	}
+	fd.mu.Unlock()
+
+	// Once the server has read the request, interrupting it queues a
+	// FUSE_INTERRUPT.
+	req = conn.NewRequest(creds, 0, 0, 0, &testObj)
+	fd.mu.Lock()
+	fut, err := conn.callFutureLocked(task, req)
+	if err != nil {
+		t.Fatalf("callFutureLocked failed: %v", err)
+	}
+	fd.mu.Unlock()
+	read()
+	if !conn.interrupt(req.id) {
+		t.Fatalf("interrupt of read request returned false")
+	}
+	intr := read()
+	if intr.hdr.Opcode != linux.FUSE_INTERRUPT || intr.id != req.id|fuseIntReqBit {
+		t.Fatalf("got request opcode %d, unique %d, want FUSE_INTERRUPT, unique %d", intr.hdr.Opcode, intr.id, req.id|fuseIntReqBit)
+	}
+
+	// A server that doesn't support interrupts isn't sent any more.
+	reply(intr.id, -int32(unix.ENOSYS))
+	conn.mu.Lock()
+	noInterrupt := conn.noInterrupt
+	conn.mu.Unlock()
+	if !noInterrupt {
+		t.Errorf("noInterrupt not set after ENOSYS reply to FUSE_INTERRUPT")
+	}
+	conn.interrupt(req.id)
+	fd.mu.Lock()
+	if !fd.queue.Empty() {
+		t.Errorf("FUSE_INTERRUPT queued after ENOSYS reply")
+	}
+	fd.mu.Unlock()
+
+	// The interrupted request still completes normally.
+	reply(req.id, -int32(unix.EINTR))
+	select {
+	case <-fut.ch:
+	default:
+		t.Fatalf("interrupted request not completed by reply")
+	}
+	if got := fut.getResponse().hdr.Error; got != -int32(unix.EINTR) {
+		t.Errorf("got error %d, want %d", got, -int32(unix.EINTR))
+	}
+}
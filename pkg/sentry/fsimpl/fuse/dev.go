@@ -110,10 +110,6 @@ func (fd *DeviceFD) Release(ctx context.Context) {
 	fd.mu.Lock()
 	defer fd.mu.Unlock()
 	if fd.conn != nil {
-		fd.conn.mu.Lock()
-		fd.conn.connected = false
-		fd.conn.mu.Unlock()
-
 		fd.conn.Abort(ctx) // +checklocksforce: fd.conn.fd.mu=fd.mu
 		fd.waitQueue.Notify(waiter.ReadableEvents)
 		fd.conn = nil
@@ -154,6 +150,10 @@ func (fd *DeviceFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.R
 	fd.mu.Lock()
 	defer fd.mu.Unlock()
 	if !fd.connected() {
+		if fd.conn != nil {
+			// The connection was aborted.
+			return 0, linuxerr.ENODEV
+		}
 		return 0, linuxerr.EPERM
 	}
 
@@ -332,6 +332,17 @@ func (fd *DeviceFD) writeLocked(ctx context.Context, src usermem.IOSequence, opt
 			// end of the write, the writeCursor will be set to 0 thereby allowing
 			// the next request to overwrite whats in the buffer,
 
+			if hdr.Unique&fuseIntReqBit != 0 {
+				// A reply to a FUSE_INTERRUPT request, which has no
+				// payload.
+				if hdr.Len != hdrLen {
+					return 0, linuxerr.EINVAL
+				}
+				fd.interruptReplyLocked(&hdr)
+				fd.writeCursor = 0
+				continue
+			}
+
 			fut, ok := fd.completions[hdr.Unique]
 			if !ok {
 				// Server sent us a response for a request we never sent,
@@ -340,6 +351,7 @@ func (fd *DeviceFD) writeLocked(ctx context.Context, src usermem.IOSequence, opt
 			}
 
 			delete(fd.completions, hdr.Unique)
+			fd.removeInterruptLocked(hdr.Unique)
 
 			// Copy over the header into the future response. The rest of the payload
 			// will be copied over to the FR's data in the next iteration.
@@ -426,6 +438,42 @@ func (fd *DeviceFD) Seek(ctx context.Context, offset int64, whence int32) (int64
 	return 0, linuxerr.ENOSYS
 }
 
+// interruptReplyLocked handles a reply to a FUSE_INTERRUPT request.
+//
+// +checklocks:fd.mu
+func (fd *DeviceFD) interruptReplyLocked(hdr *linux.FUSEHeaderOut) {
+	unique := hdr.Unique &^ fuseIntReqBit
+	switch hdr.Error {
+	case -int32(unix.ENOSYS):
+		// The server doesn't support interrupts; stop sending them.
+		fd.conn.mu.Lock()
+		fd.conn.noInterrupt = true
+		fd.conn.mu.Unlock()
+	case -int32(unix.EAGAIN):
+		// The server hasn't seen the interrupted request yet and asks for the
+		// interrupt to be sent again.
+		if _, ok := fd.completions[unique]; ok {
+			fd.removeInterruptLocked(unique)
+			fd.queue.PushFront(newInterruptRequest(unique))
+			fd.waitQueue.Notify(waiter.ReadableEvents)
+		}
+	}
+}
+
+// removeInterruptLocked removes the FUSE_INTERRUPT request for the request
+// with the given unique ID from the queue, if the server hasn't read it yet.
+// Interrupts are always queued ahead of ordinary requests.
+//
+// +checklocks:fd.mu
+func (fd *DeviceFD) removeInterruptLocked(unique linux.FUSEOpID) {
+	for r := fd.queue.Front(); r != nil && r.hdr.Opcode == linux.FUSE_INTERRUPT; r = r.Next() {
+		if r.id == unique|fuseIntReqBit {
+			fd.queue.Remove(r)
+			return
+		}
+	}
+}
+
 // sendResponse sends a response to the waiting task (if any).
 //
 // +checklocks:fd.mu
@@ -0,0 +1,411 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// ControlName is the name of the FUSE control filesystem, which is usually
+// mounted at /sys/fs/fuse/connections.
+const ControlName = "fusectl"
+
+// controlConns holds the FUSE connections listed by fusectl filesystems,
+// keyed by connection.ctlID.
+var controlConns struct {
+	mu sync.Mutex
+	m  map[uint32]*connection
+}
+
+// registerControlConn lists conn in fusectl filesystems.
+func registerControlConn(conn *connection) {
+	controlConns.mu.Lock()
+	defer controlConns.mu.Unlock()
+	if controlConns.m == nil {
+		controlConns.m = make(map[uint32]*connection)
+	}
+	controlConns.m[conn.ctlID] = conn
+	conn.ctlListed = true
+}
+
+// unregisterControlConn removes conn from fusectl filesystems.
+func unregisterControlConn(conn *connection) {
+	controlConns.mu.Lock()
+	defer controlConns.mu.Unlock()
+	delete(controlConns.m, conn.ctlID)
+	conn.ctlListed = false
+}
+
+// afterLoad is invoked by stateify.
+func (conn *connection) afterLoad() {
+	if conn.ctlListed {
+		registerControlConn(conn)
+	}
+}
+
+// ControlFilesystemType implements vfs.FilesystemType for fusectl.
+//
+// +stateify savable
+type ControlFilesystemType struct{}
+
+// controlFilesystem implements vfs.FilesystemImpl for fusectl.
+//
+// +stateify savable
+type controlFilesystem struct {
+	kernfs.Filesystem
+
+	devMinor uint32
+}
+
+// Name implements vfs.FilesystemType.Name.
+func (ControlFilesystemType) Name() string {
+	return ControlName
+}
+
+// Release implements vfs.FilesystemType.Release.
+func (ControlFilesystemType) Release(ctx context.Context) {}
+
+// GetFilesystem implements vfs.FilesystemType.GetFilesystem.
+func (fsType ControlFilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, source string, opts vfs.GetFilesystemOptions) (*vfs.Filesystem, *vfs.Dentry, error) {
+	devMinor, err := vfsObj.GetAnonBlockDevMinor()
+	if err != nil {
+		return nil, nil, err
+	}
+	fs := &controlFilesystem{devMinor: devMinor}
+	fs.VFSFilesystem().Init(vfsObj, &fsType, fs)
+
+	root := &controlRootInode{fs: fs}
+	root.InodeAttrs.Init(ctx, creds, linux.UNNAMED_MAJOR, devMinor, fs.NextIno(), linux.ModeDirectory|0755)
+	root.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+	var rootD kernfs.Dentry
+	rootD.InitRoot(&fs.Filesystem, root)
+	return fs.VFSFilesystem(), rootD.VFSDentry(), nil
+}
+
+// Release implements vfs.FilesystemImpl.Release.
+func (fs *controlFilesystem) Release(ctx context.Context) {
+	fs.Filesystem.VFSFilesystem().VirtualFilesystem().PutAnonBlockDevMinor(fs.devMinor)
+	fs.Filesystem.Release(ctx)
+}
+
+// MountOptions implements vfs.FilesystemImpl.MountOptions.
+func (fs *controlFilesystem) MountOptions() string {
+	return ""
+}
+
+// controlStatFS partially implements kernfs.Inode for fusectl inodes.
+//
+// +stateify savable
+type controlStatFS struct{}
+
+// StatFS implements kernfs.Inode.StatFS.
+func (*controlStatFS) StatFS(context.Context, *vfs.Filesystem) (linux.Statfs, error) {
+	return vfs.GenericStatFS(linux.FUSECTL_SUPER_MAGIC), nil
+}
+
+// controlRootInode is the root of a fusectl filesystem, which contains a
+// directory for each FUSE connection.
+//
+// +stateify savable
+type controlRootInode struct {
+	controlStatFS
+	kernfs.InodeAlwaysValid
+	kernfs.InodeAttrs
+	kernfs.InodeDirectoryNoNewChildren
+	kernfs.InodeNoopRefCount
+	kernfs.InodeNotSymlink
+	kernfs.InodeWatches
+	kernfs.OrderedChildren
+
+	locks vfs.FileLocks
+
+	fs *controlFilesystem
+}
+
+var _ kernfs.Inode = (*controlRootInode)(nil)
+
+// Lookup implements kernfs.inodeDirectory.Lookup.
+func (i *controlRootInode) Lookup(ctx context.Context, name string) (kernfs.Inode, error) {
+	id, err := strconv.ParseUint(name, 10, 32)
+	if err != nil {
+		return nil, linuxerr.ENOENT
+	}
+	controlConns.mu.Lock()
+	conn, ok := controlConns.m[uint32(id)]
+	controlConns.mu.Unlock()
+	if !ok {
+		return nil, linuxerr.ENOENT
+	}
+	return i.fs.newConnDir(ctx, conn), nil
+}
+
+// IterDirents implements kernfs.inodeDirectory.IterDirents.
+func (i *controlRootInode) IterDirents(ctx context.Context, mnt *vfs.Mount, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+	controlConns.mu.Lock()
+	ids := make([]int, 0, len(controlConns.m))
+	for id := range controlConns.m {
+		ids = append(ids, int(id))
+	}
+	controlConns.mu.Unlock()
+	if relOffset >= int64(len(ids)) {
+		return offset, nil
+	}
+
+	sort.Ints(ids)
+	for _, id := range ids[relOffset:] {
+		dirent := vfs.Dirent{
+			Name:    strconv.Itoa(id),
+			Type:    linux.DT_DIR,
+			Ino:     i.fs.NextIno(),
+			NextOff: offset + 1,
+		}
+		if err := cb.Handle(dirent); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
+
+// Open implements kernfs.Inode.Open.
+func (i *controlRootInode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd, err := kernfs.NewGenericDirectoryFD(rp.Mount(), d, &i.OrderedChildren, &i.locks, &opts, kernfs.GenericDirectoryFDOptions{
+		SeekEnd: kernfs.SeekEndZero,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fd.VFSFileDescription(), nil
+}
+
+// SetStat implements kernfs.Inode.SetStat not allowing inode attributes to be changed.
+func (*controlRootInode) SetStat(context.Context, *vfs.Filesystem, *auth.Credentials, vfs.SetStatOptions) error {
+	return linuxerr.EPERM
+}
+
+// controlConnDir is the directory of a FUSE connection in fusectl.
+//
+// +stateify savable
+type controlConnDir struct {
+	controlStatFS
+	kernfs.StaticDirectory
+}
+
+// newConnDir returns the directory of conn, which is owned by the user that
+// mounted the FUSE filesystem, as in Linux.
+func (fs *controlFilesystem) newConnDir(ctx context.Context, conn *connection) kernfs.Inode {
+	creds := auth.CredentialsFromContext(ctx).Fork()
+	creds.EffectiveKUID = conn.ctlUID
+	creds.EffectiveKGID = conn.ctlGID
+
+	d := &controlConnDir{}
+	d.StaticDirectory.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), 0500, kernfs.GenericDirectoryFDOptions{
+		SeekEnd: kernfs.SeekEndStaticEntries,
+	})
+	d.InitRefs()
+	d.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+	d.IncLinks(d.OrderedChildren.Populate(map[string]kernfs.Inode{
+		"abort":                fs.newControlFile(ctx, creds, &abortFile{conn: conn}, 0200),
+		"waiting":              fs.newControlFile(ctx, creds, &waitingFile{conn: conn}, 0400),
+		"max_background":       fs.newControlFile(ctx, creds, &maxBackgroundFile{conn: conn}, 0600),
+		"congestion_threshold": fs.newControlFile(ctx, creds, &congestionThresholdFile{conn: conn}, 0600),
+	}))
+	return d
+}
+
+// controlFile is implemented by the files in a fusectl connection directory.
+type controlFile interface {
+	kernfs.Inode
+	vfs.WritableDynamicBytesSource
+	init(ctx context.Context, creds *auth.Credentials, devMinor uint32, ino uint64, perm linux.FileMode)
+}
+
+// controlFileBase partially implements controlFile.
+//
+// +stateify savable
+type controlFileBase struct {
+	controlStatFS
+	kernfs.DynamicBytesFile
+
+	conn *connection
+}
+
+func (fs *controlFilesystem) newControlFile(ctx context.Context, creds *auth.Credentials, f controlFile, perm linux.FileMode) kernfs.Inode {
+	f.init(ctx, creds, fs.devMinor, fs.NextIno(), perm)
+	return f
+}
+
+// SetStat implements kernfs.Inode.SetStat not allowing inode attributes to be changed.
+func (*controlFileBase) SetStat(context.Context, *vfs.Filesystem, *auth.Credentials, vfs.SetStatOptions) error {
+	return linuxerr.EPERM
+}
+
+// abortFile implements the abort file, writing to which aborts the connection.
+//
+// +stateify savable
+type abortFile struct {
+	controlFileBase
+}
+
+func (f *abortFile) init(ctx context.Context, creds *auth.Credentials, devMinor uint32, ino uint64, perm linux.FileMode) {
+	f.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, devMinor, ino, f, perm)
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (f *abortFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (f *abortFile) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	conn := f.conn
+	conn.fd.mu.Lock()
+	defer conn.fd.mu.Unlock()
+	conn.mu.Lock()
+	if conn.connected {
+		conn.aborted = true
+	}
+	conn.mu.Unlock()
+	conn.Abort(ctx)
+	conn.fd.waitQueue.Notify(waiter.ReadableEvents)
+	return src.NumBytes(), nil
+}
+
+// waitingFile implements the waiting file, which contains the number of
+// requests that have been sent to the server, or are waiting to be, and
+// haven't been answered yet.
+//
+// +stateify savable
+type waitingFile struct {
+	controlFileBase
+}
+
+func (f *waitingFile) init(ctx context.Context, creds *auth.Credentials, devMinor uint32, ino uint64, perm linux.FileMode) {
+	f.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, devMinor, ino, f, perm)
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (f *waitingFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	f.conn.fd.mu.Lock()
+	n := f.conn.fd.numActiveRequests
+	f.conn.fd.mu.Unlock()
+	fmt.Fprintf(buf, "%d\n", n)
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (f *waitingFile) Write(context.Context, *vfs.FileDescription, usermem.IOSequence, int64) (int64, error) {
+	return 0, linuxerr.EACCES
+}
+
+// maxBackgroundFile implements the max_background file, which contains the
+// maximum number of async requests that can be outstanding.
+//
+// +stateify savable
+type maxBackgroundFile struct {
+	controlFileBase
+}
+
+func (f *maxBackgroundFile) init(ctx context.Context, creds *auth.Credentials, devMinor uint32, ino uint64, perm linux.FileMode) {
+	f.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, devMinor, ino, f, perm)
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (f *maxBackgroundFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	f.conn.asyncMu.Lock()
+	n := f.conn.asyncNumMax
+	f.conn.asyncMu.Unlock()
+	fmt.Fprintf(buf, "%d\n", n)
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (f *maxBackgroundFile) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	val, n, err := parseControlValue(ctx, src)
+	if err != nil {
+		return n, err
+	}
+	f.conn.asyncMu.Lock()
+	f.conn.asyncNumMax = val
+	f.conn.asyncMu.Unlock()
+	return n, nil
+}
+
+// congestionThresholdFile implements the congestion_threshold file, which
+// contains the number of outstanding async requests above which the connection
+// is considered congested.
+//
+// +stateify savable
+type congestionThresholdFile struct {
+	controlFileBase
+}
+
+func (f *congestionThresholdFile) init(ctx context.Context, creds *auth.Credentials, devMinor uint32, ino uint64, perm linux.FileMode) {
+	f.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, devMinor, ino, f, perm)
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (f *congestionThresholdFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	f.conn.asyncMu.Lock()
+	n := f.conn.asyncCongestionThreshold
+	f.conn.asyncMu.Unlock()
+	fmt.Fprintf(buf, "%d\n", n)
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (f *congestionThresholdFile) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	val, n, err := parseControlValue(ctx, src)
+	if err != nil {
+		return n, err
+	}
+	f.conn.asyncMu.Lock()
+	f.conn.asyncCongestionThreshold = val
+	f.conn.asyncMu.Unlock()
+	return n, nil
+}
+
+// parseControlValue parses the decimal value written to a fusectl file, which
+// must fit in a uint16 as in Linux's fs/fuse/control.c:fuse_conn_limit_write().
+func parseControlValue(ctx context.Context, src usermem.IOSequence) (uint16, int64, error) {
+	const maxLen = 32
+	if src.NumBytes() > maxLen {
+		return 0, 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, int64(n), err
+	}
+	val, err := strconv.ParseUint(strings.TrimSpace(string(buf[:n])), 10, 16)
+	if err != nil {
+		return 0, int64(n), linuxerr.EINVAL
+	}
+	return uint16(val), int64(n), nil
+}
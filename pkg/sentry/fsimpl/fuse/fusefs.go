@@ -27,9 +27,11 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/marshal"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
 
@@ -96,6 +98,10 @@ type filesystem struct {
 
 	// opts is the options the fusefs is initialized with.
 	opts *filesystemOptions
+
+	// mfp is used to allocate memory that caches regular file contents. mfp
+	// is immutable.
+	mfp pgalloc.MemoryFileProvider
 }
 
 // Name implements vfs.FilesystemType.Name.
@@ -264,6 +270,10 @@ func newFUSEFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, fsTyp
 			log.Warningf("fuse.NewFUSEFilesystem: NewFUSEConnection failed with error: %v", err)
 			return nil, linuxerr.EINVAL
 		}
+		conn.ctlID = devMinor
+		conn.ctlUID = opts.uid
+		conn.ctlGID = opts.gid
+		registerControlConn(conn)
 		fuseFD.conn = conn
 	}
 
@@ -271,6 +281,7 @@ func newFUSEFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, fsTyp
 		devMinor: devMinor,
 		opts:     opts,
 		conn:     fuseFD.conn,
+		mfp:      pgalloc.MemoryFileProviderFromContext(ctx),
 	}
 	fs.VFSFilesystem().Init(vfsObj, fsType, fs)
 	return fs, nil
@@ -278,6 +289,9 @@ func newFUSEFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, fsTyp
 
 // Release implements vfs.FilesystemImpl.Release.
 func (fs *filesystem) Release(ctx context.Context) {
+	if fs.conn.ctlID == fs.devMinor {
+		unregisterControlConn(fs.conn)
+	}
 	fs.Filesystem.VFSFilesystem().VirtualFilesystem().PutAnonBlockDevMinor(fs.devMinor)
 	fs.Filesystem.Release(ctx)
 }
@@ -336,6 +350,17 @@ type inode struct {
 	// if newEntry got a new Fh from server it saves it here, until returned by Open
 	isNewFh   bool
 	newFhData NewFhData
+
+	// dataMu protects cache.
+	dataMu sync.Mutex `state:"nosave"`
+
+	// cache maps offsets into a regular file to the cached contents at those
+	// offsets, which were read from the server through file descriptions
+	// without FOPEN_DIRECT_IO. It is dropped whenever the file is opened
+	// without FOPEN_KEEP_CACHE. All cached pages are evictable.
+	//
+	// +checklocks:dataMu
+	cache fsutil.FileRangeSet
 }
 
 func (fs *filesystem) newRoot(ctx context.Context, creds *auth.Credentials, mode linux.FileMode) *kernfs.Dentry {
@@ -465,6 +490,9 @@ func (i *inode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentr
 	}
 	if isDir {
 		fd.OpenFlag &= ^uint32(linux.FOPEN_DIRECT_IO)
+	} else if fd.OpenFlag&linux.FOPEN_KEEP_CACHE == 0 {
+		// The server doesn't vouch for the data cached by earlier opens.
+		i.invalidateCache()
 	}
 
 	// TODO(gvisor.dev/issue/3234): invalidate mmap after implemented it for FUSE Inode
@@ -485,6 +513,7 @@ func (i *inode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentr
 		i.size.Store(0)
 		i.fs.conn.mu.Unlock()
 		i.attributeTime = 0
+		i.truncateCache(0)
 	}
 
 	if err := fd.vfsfd.Init(fdImpl, opts.Flags, rp.Mount(), d.VFSDentry(), fdOptions); err != nil {
@@ -810,7 +839,9 @@ func (i *inode) getAttr(ctx context.Context, fs *vfs.Filesystem, opts vfs.StatOp
 	}
 
 	// Set the size if no error (after SetStat() check).
-	i.size.Store(out.Attr.Size)
+	if oldSize := i.size.Swap(out.Attr.Size); out.Attr.Size < oldSize {
+		i.truncateCache(out.Attr.Size)
+	}
 
 	return out.Attr, nil
 }
@@ -838,7 +869,10 @@ func (i *inode) Stat(ctx context.Context, fs *vfs.Filesystem, opts vfs.StatOptio
 
 // DecRef implements kernfs.Inode.DecRef.
 func (i *inode) DecRef(ctx context.Context) {
-	i.inodeRefs.DecRef(func() { i.Destroy(ctx) })
+	i.inodeRefs.DecRef(func() {
+		i.invalidateCache()
+		i.Destroy(ctx)
+	})
 }
 
 // StatFS implements kernfs.Inode.StatFS.
@@ -951,6 +985,10 @@ func (i *inode) setAttr(ctx context.Context, fs *vfs.Filesystem, creds *auth.Cre
 	}); err != nil {
 		return err
 	}
+	if opts.Stat.Mask&linux.STATX_SIZE != 0 {
+		i.size.Store(out.Attr.Size)
+		i.truncateCache(out.Attr.Size)
+	}
 
 	return nil
 }
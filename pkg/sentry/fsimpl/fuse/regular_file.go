@@ -22,6 +22,12 @@ import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
@@ -58,8 +64,6 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		return 0, linuxerr.EINVAL
 	}
 
-	// TODO(gvisor.dev/issue/3678): Add direct IO support.
-
 	inode := fd.inode()
 
 	// Reading beyond EOF, update file size if outdated.
@@ -79,17 +83,24 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		size = int64(fileSize) - offset
 	}
 
-	buffers, n, err := inode.fs.ReadInPages(ctx, fd, uint64(offset), uint32(size))
+	// Files opened with FOPEN_DIRECT_IO or O_DIRECT bypass the page cache, as
+	// does everything if the MemoryFile doesn't want cached pages.
+	if fd.DirectIO || fd.vfsfd.StatusFlags()&linux.O_DIRECT != 0 || !inode.fs.mfp.MemoryFile().ShouldCacheEvictable() {
+		return fd.readDirect(ctx, dst, uint64(offset), uint32(size))
+	}
+	return fd.readCached(ctx, dst, uint64(offset), uint64(size))
+}
+
+// readDirect reads size bytes at offset from the server into dst.
+func (fd *regularFileFD) readDirect(ctx context.Context, dst usermem.IOSequence, offset uint64, size uint32) (int64, error) {
+	buffers, n, err := fd.inode().fs.ReadInPages(ctx, fd, offset, size)
 	if err != nil {
 		return 0, err
 	}
 
-	// TODO(gvisor.dev/issue/3237): support indirect IO (e.g. caching),
-	// store the bytes that were read ahead.
-
 	// Update the number of bytes to copy for short read.
-	if n < uint32(size) {
-		size = int64(n)
+	if n < size {
+		size = n
 	}
 
 	// Copy the bytes read to the dst.
@@ -98,8 +109,8 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 	var copied int64
 	for _, buffer := range buffers {
 		toCopy := int64(len(buffer))
-		if copied+toCopy > size {
-			toCopy = size - copied
+		if copied+toCopy > int64(size) {
+			toCopy = int64(size) - copied
 		}
 		cp, err := dst.DropFirst64(copied).CopyOut(ctx, buffer[:toCopy])
 		if err != nil {
@@ -114,6 +125,75 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 	return copied, nil
 }
 
+// readCached reads size bytes at offset into dst through the inode's page
+// cache, filling it from the server as needed.
+//
+// Preconditions: size > 0.
+func (fd *regularFileFD) readCached(ctx context.Context, dst usermem.IOSequence, offset, size uint64) (int64, error) {
+	i := fd.inode()
+	mf := i.fs.mfp.MemoryFile()
+	end := offset + size
+	pgend, ok := hostarch.PageRoundUp(end)
+	if !ok {
+		return 0, linuxerr.EINVAL
+	}
+	mr := memmap.MappableRange{hostarch.PageRoundDown(offset), pgend}
+
+	// Cached data is copied into an intermediate buffer while dataMu is
+	// locked, since filling the cache blocks on the server, during which the
+	// task's address space is deactivated; see regularFileFD.pwrite.
+	i.dataMu.Lock()
+	_, fillErr := i.cache.Fill(ctx, mr, mr, i.size.Load(), mf, usage.PageCache, true /* populate */, fd.readAt)
+	mf.MarkEvictable(i, pgalloc.EvictableRange{mr.Start, mr.End})
+	// A short read from the server shrinks the file.
+	if fileSize := i.size.Load(); end > fileSize {
+		i.cache.Truncate(fileSize, mf)
+		end = fileSize
+		if offset > end {
+			end = offset
+		}
+	}
+	buf := make([]byte, end-offset)
+	n, err := i.readCacheLocked(buf, offset)
+	i.dataMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		if fillErr != nil {
+			return 0, fillErr
+		}
+		return 0, io.EOF
+	}
+
+	i.InodeAttrs.TouchAtime(ctx, fd.vfsfd.Mount())
+	cp, err := dst.CopyOut(ctx, buf[:n])
+	return int64(cp), err
+}
+
+// readAt reads from the server into dsts at offset. It is used to fill the
+// page cache.
+func (fd *regularFileFD) readAt(ctx context.Context, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+	size := dsts.NumBytes()
+	if size > math.MaxUint32 {
+		size = math.MaxUint32 &^ (hostarch.PageSize - 1)
+	}
+	buffers, _, err := fd.inode().fs.ReadInPages(ctx, fd, offset, uint32(size))
+	var done uint64
+	for _, buffer := range buffers {
+		if dsts.IsEmpty() {
+			break
+		}
+		cp, err := safemem.CopySeq(dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buffer)))
+		done += cp
+		dsts = dsts.DropFirst64(cp)
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, err
+}
+
 // Read implements vfs.FileDescriptionImpl.Read.
 func (fd *regularFileFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
 	fd.offMu.Lock()
@@ -189,9 +269,6 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 	src = src.TakeFirst64(srclen)
 
-	// TODO(gvisor.dev/issue/3237): Add cache support:
-	// buffer cache. Ideally we write from src to our buffer cache first.
-	// The slice passed to fs.Write() should be a slice from buffer cache.
 	data := make([]byte, srclen)
 	// Reason for making a copy here: connection.Call() blocks on kerneltask,
 	// which in turn acquires mm.activeMu lock. Functions like CopyInTo() will
@@ -219,6 +296,7 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 	written = int64(n)
 	finalOff = offset + written
+	inode.writeCache(uint64(offset), data[:n])
 
 	if finalOff > int64(inode.size.Load()) {
 		inode.size.Store(uint64(finalOff))
@@ -227,3 +305,78 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 	return
 }
+
+// readCacheLocked copies cached data starting at offset into dst, stopping at
+// the first uncached page. It returns the number of bytes copied.
+//
+// +checklocks:i.dataMu
+func (i *inode) readCacheLocked(dst []byte, offset uint64) (uint64, error) {
+	mf := i.fs.mfp.MemoryFile()
+	end := offset + uint64(len(dst))
+	var done uint64
+	for seg := i.cache.FindSegment(offset); seg.Ok() && offset+done < end; seg = seg.NextSegment() {
+		if seg.Start() > offset+done {
+			break
+		}
+		ims, err := mf.MapInternal(seg.FileRangeOf(seg.Range().Intersect(memmap.MappableRange{offset + done, end})), hostarch.Read)
+		if err != nil {
+			return done, err
+		}
+		cp, err := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(dst[done:])), ims)
+		done += cp
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// writeCache updates the cached pages overlapping offset with data, which has
+// been written to the server at offset. Writes are always sent to the server
+// synchronously, so the cache never holds dirty data.
+func (i *inode) writeCache(offset uint64, data []byte) {
+	mf := i.fs.mfp.MemoryFile()
+	mr := memmap.MappableRange{offset, offset + uint64(len(data))}
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+	for seg := i.cache.LowerBoundSegment(mr.Start); seg.Ok() && seg.Start() < mr.End; seg = seg.NextSegment() {
+		segMR := seg.Range().Intersect(mr)
+		ims, err := mf.MapInternal(seg.FileRangeOf(segMR), hostarch.Write)
+		if err == nil {
+			_, err = safemem.CopySeq(ims, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(data[segMR.Start-offset:segMR.End-offset])))
+		}
+		if err != nil {
+			// Drop the stale pages, so that they're read from the server
+			// again.
+			log.Warningf("fusefs: failed to update cached data %v: %v", segMR, err)
+			pgend, _ := hostarch.PageRoundUp(mr.End)
+			i.cache.Drop(memmap.MappableRange{hostarch.PageRoundDown(mr.Start), pgend}, mf)
+			return
+		}
+	}
+}
+
+// truncateCache updates the page cache to reflect the file being truncated to
+// size.
+func (i *inode) truncateCache(size uint64) {
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+	i.cache.Truncate(size, i.fs.mfp.MemoryFile())
+}
+
+// invalidateCache drops the whole page cache, which is done when a file is
+// opened without FOPEN_KEEP_CACHE.
+func (i *inode) invalidateCache() {
+	mf := i.fs.mfp.MemoryFile()
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+	mf.MarkAllUnevictable(i)
+	i.cache.DropAll(mf)
+}
+
+// Evict implements pgalloc.EvictableMemoryUser.Evict.
+func (i *inode) Evict(ctx context.Context, er pgalloc.EvictableRange) {
+	i.dataMu.Lock()
+	defer i.dataMu.Unlock()
+	i.cache.Drop(memmap.MappableRange{er.Start, er.End}, i.fs.mfp.MemoryFile())
+}
@@ -102,22 +102,41 @@ type Request struct {
 	noReply bool
 }
 
+// fuseIntReqBit is set in the unique ID of FUSE_INTERRUPT requests, which is
+// otherwise the unique ID of the interrupted request.
+const fuseIntReqBit linux.FUSEOpID = 1
+
 // NewRequest creates a new request that can be sent to the FUSE server.
 func (conn *connection) NewRequest(creds *auth.Credentials, pid uint32, ino uint64, opcode linux.FUSEOpcode, payload marshal.Marshallable) *Request {
 	conn.fd.mu.Lock()
-	defer conn.fd.mu.Unlock()
 	conn.fd.nextOpID += linux.FUSEOpID(reqIDStep)
+	unique := conn.fd.nextOpID
+	conn.fd.mu.Unlock()
 
-	hdrLen := (*linux.FUSEHeaderIn)(nil).SizeBytes()
-	hdr := linux.FUSEHeaderIn{
-		Len:    uint32(hdrLen + payload.SizeBytes()),
+	return newRequest(linux.FUSEHeaderIn{
 		Opcode: opcode,
-		Unique: conn.fd.nextOpID,
+		Unique: unique,
 		NodeID: ino,
 		UID:    uint32(creds.EffectiveKUID),
 		GID:    uint32(creds.EffectiveKGID),
 		PID:    pid,
-	}
+	}, payload)
+}
+
+// newInterruptRequest creates a FUSE_INTERRUPT request for the request with
+// the given unique ID. As in Linux, the request carries no credentials.
+func newInterruptRequest(unique linux.FUSEOpID) *Request {
+	return newRequest(linux.FUSEHeaderIn{
+		Opcode: linux.FUSE_INTERRUPT,
+		Unique: unique | fuseIntReqBit,
+	}, &linux.FUSEInterruptIn{Unique: unique})
+}
+
+// newRequest creates a request with the given header, whose length is filled
+// in, followed by payload.
+func newRequest(hdr linux.FUSEHeaderIn, payload marshal.Marshallable) *Request {
+	hdrLen := (*linux.FUSEHeaderIn)(nil).SizeBytes()
+	hdr.Len = uint32(hdrLen + payload.SizeBytes())
 
 	buf := make([]byte, hdr.Len)
 
@@ -138,6 +157,7 @@ func (conn *connection) NewRequest(creds *auth.Credentials, pid uint32, ino uint
 // +stateify savable
 type futureResponse struct {
 	opcode linux.FUSEOpcode
+	unique linux.FUSEOpID
 	ch     chan struct{}
 	hdr    *linux.FUSEHeaderOut
 	data   []byte
@@ -150,6 +170,7 @@ type futureResponse struct {
 func newFutureResponse(req *Request) *futureResponse {
 	return &futureResponse{
 		opcode: req.hdr.Opcode,
+		unique: req.id,
 		ch:     make(chan struct{}),
 		async:  req.async,
 	}
@@ -157,14 +178,25 @@ func newFutureResponse(req *Request) *futureResponse {
 
 // resolve blocks the task until the server responds to its corresponding request,
 // then returns a resolved response.
-func (f *futureResponse) resolve(t *kernel.Task) (*Response, error) {
+//
+// If the task is interrupted before the server has read the request, the
+// request is cancelled. Otherwise, as in Linux, the server is sent a
+// FUSE_INTERRUPT request and the task keeps waiting for the response, without
+// being interruptible; a server that never replies can be dealt with by
+// aborting the connection through fusectl.
+func (f *futureResponse) resolve(t *kernel.Task, conn *connection) (*Response, error) {
 	// Return directly for async requests.
 	if f.async {
 		return nil, nil
 	}
 
 	if err := t.Block(f.ch); err != nil {
-		return nil, err
+		if !conn.interrupt(f.unique) {
+			return nil, err
+		}
+		t.UninterruptibleSleepStart(true /* deactivate */)
+		<-f.ch
+		t.UninterruptibleSleepFinish(true /* activate */)
 	}
 
 	return f.getResponse(), nil
@@ -0,0 +1,206 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/lisafs"
+)
+
+// Delegations let the client rely on cached state in InteropModeShared
+// without revalidating it. While the server has delegated a directory to the
+// client, it recalls the delegation as soon as the directory, its entries or
+// the files it contains change. The client requests delegations on the
+// directories it revalidates.
+//
+// A delegation vouches for:
+//
+//   - The directory's metadata and, if cached, its dirents.
+//
+//   - The identity and metadata of children whose metadata was last fetched
+//     after the delegation was granted (see dentry.delegatedAt). Hard-linked
+//     files and files open for writing are excluded, since they can change
+//     without an event on this directory.
+//
+// Since recalls are asynchronous, the client also stops relying on a
+// delegation as soon as it changes the directory itself.
+
+// initDelegations starts receiving delegation recalls from the server, if
+// delegations are useful and supported.
+func (fs *filesystem) initDelegations() {
+	if fs.opts.interop != InteropModeShared {
+		// Cached metadata is authoritative anyway.
+		return
+	}
+	fs.delegationsMu.Lock()
+	fs.delegations = make(map[lisafs.FDID]*dentry)
+	fs.delegationsMu.Unlock()
+	fs.delegationsEnabled.Store(0)
+	if fs.clientLisa.WatchRecalls(fs.recallDelegations) {
+		fs.delegationsEnabled.Store(1)
+	}
+}
+
+// recallDelegations is called when the server recalls the delegations on
+// fds, or with a nil slice when all delegations have been lost.
+func (fs *filesystem) recallDelegations(fds []lisafs.FDID) {
+	var recalled []*dentry
+	fs.delegationsMu.Lock()
+	if fds == nil {
+		fs.delegationsEnabled.Store(0)
+		for id, d := range fs.delegations {
+			delete(fs.delegations, id)
+			d.delegation.Store(0)
+			recalled = append(recalled, d)
+		}
+	}
+	for _, id := range fds {
+		if d, ok := fs.delegations[id]; ok {
+			delete(fs.delegations, id)
+			d.delegation.Store(0)
+			recalled = append(recalled, d)
+		}
+	}
+	fs.delegationsMu.Unlock()
+
+	// Dirents are only cached while delegated; children and their metadata
+	// are revalidated the next time they are used.
+	for _, d := range recalled {
+		d.dirMu.Lock()
+		d.clearDirentsLocked()
+		d.dirMu.Unlock()
+	}
+}
+
+// delegate requests delegations on the directories in ds that don't hold one.
+//
+// Preconditions: fs.renameMu must be locked.
+func (fs *filesystem) delegate(ctx context.Context, ds []*dentry) {
+	if fs.delegationsEnabled.Load() == 0 {
+		return
+	}
+	// Track the requested delegations before making the RPC, so that recalls
+	// that race with it are not lost.
+	var fds []lisafs.FDID
+	fs.delegationsMu.Lock()
+	for _, d := range ds {
+		if !d.isDir() || d.directfs != nil || !d.controlFDLisa.Ok() || d.delegation.Load() != 0 {
+			continue
+		}
+		id, ok := d.controlFDLisa.CurrentID()
+		if !ok {
+			// d's FD hasn't been re-derived since the client reconnected.
+			continue
+		}
+		if _, ok := fs.delegations[id]; ok {
+			// Already requested.
+			continue
+		}
+		fs.delegations[id] = d
+		fds = append(fds, id)
+	}
+	fs.delegationsMu.Unlock()
+	if len(fds) == 0 {
+		return
+	}
+
+	granted, err := fs.clientLisa.Delegate(ctx, fds)
+	if err != nil {
+		ctx.Debugf("gofer.filesystem.delegate: Delegate RPC failed: %v", err)
+	}
+	fs.delegationsMu.Lock()
+	defer fs.delegationsMu.Unlock()
+	for _, id := range granted {
+		// Delegations recalled in the meantime are no longer tracked.
+		if d, ok := fs.delegations[id]; ok {
+			fs.lastDelegation++
+			d.delegation.Store(fs.lastDelegation)
+		}
+	}
+	for _, id := range fds {
+		if d, ok := fs.delegations[id]; ok && d.delegation.Load() == 0 {
+			delete(fs.delegations, id)
+		}
+	}
+}
+
+// breakDelegationLocked stops relying on the delegation held on d, if any.
+// It must be called when this client changes d, since the server's recall
+// may only arrive later.
+//
+// Preconditions: d.dirMu must be locked.
+func (d *dentry) breakDelegationLocked() {
+	if d.delegation.Load() == 0 {
+		return
+	}
+	d.forgetDelegation()
+	d.clearDirentsLocked()
+}
+
+// forgetDelegation stops tracking the delegation held on d, if any.
+func (d *dentry) forgetDelegation() {
+	if !d.isDir() || !d.controlFDLisa.Ok() {
+		return
+	}
+	fs := d.fs
+	fs.delegationsMu.Lock()
+	defer fs.delegationsMu.Unlock()
+	if id, ok := d.controlFDLisa.CurrentID(); ok && fs.delegations[id] == d {
+		delete(fs.delegations, id)
+	}
+	d.delegation.Store(0)
+}
+
+// lookupDelegated returns true if the delegation held on d's parent
+// guarantees that d is still the file at its name.
+//
+// Preconditions: d.fs.renameMu must be locked.
+func (d *dentry) lookupDelegated() bool {
+	if d.parent == nil {
+		return false
+	}
+	gen := d.parent.delegation.Load()
+	return gen != 0 && d.delegatedAt.Load() == gen
+}
+
+// metadataDelegated returns true if delegations guarantee that d's cached
+// metadata, except for its atime, is up to date.
+//
+// Preconditions: d.fs.renameMu must be locked.
+func (d *dentry) metadataDelegated() bool {
+	if d.isSynthetic() {
+		return false
+	}
+	if d.isDir() {
+		return d.delegation.Load() != 0
+	}
+	if !d.lookupDelegated() || d.nlink.Load() > 1 {
+		return false
+	}
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	return !d.writeFDLisa.Ok()
+}
+
+// metadataDelegated is the same as d.metadataDelegated, except that it locks
+// fs.renameMu itself.
+func (fs *filesystem) metadataDelegated(d *dentry) bool {
+	if fs.delegationsEnabled.Load() == 0 {
+		return false
+	}
+	fs.renameMu.RLock()
+	defer fs.renameMu.RUnlock()
+	return d.metadataDelegated()
+}
@@ -0,0 +1,343 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/lisafs"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+)
+
+// procSelfFD is a host FD for the /proc/self/fd directory. It is used to
+// reopen host FDs of files accessed with directfs. procSelfFD is -1 if
+// OpenProcSelfFD has not been called.
+var procSelfFD = -1
+
+// OpenProcSelfFD opens the /proc/self/fd directory, which is required to open
+// files on filesystems mounted with the directfs option. It must be called
+// before seccomp filters are installed.
+func OpenProcSelfFD() error {
+	fd, err := unix.Open("/proc/self/fd", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("error opening /proc/self/fd: %v", err)
+	}
+	procSelfFD = fd
+	return nil
+}
+
+// directfsDentry holds the host state of a dentry whose file is accessed with
+// host syscalls instead of RPCs to the gofer. This is only possible on
+// read-only mounts, for which the gofer donates a host FD for the root of the
+// mount. All other dentries are then opened relative to their parent.
+type directfsDentry struct {
+	// controlFD is a host FD for the file, opened either read-only or with
+	// O_PATH. It is used to make path based syscalls relative to the file.
+	// controlFD is immutable and owned by the dentry.
+	controlFD int
+}
+
+// initDirectfsRoot asks the gofer to donate a host FD for fs.root. If the
+// gofer refuses, fs keeps using RPCs for all operations.
+//
+// Preconditions: fs.opts.directfs.
+func (fs *filesystem) initDirectfsRoot(ctx context.Context) {
+	if !fs.clientLisa.IsSupported(lisafs.DonatePathFD) {
+		log.Warningf("gofer server does not support directfs, falling back to RPCs")
+		return
+	}
+	hostFD, err := fs.root.controlFDLisa.DonatePathFD(ctx)
+	if err != nil {
+		log.Warningf("gofer server refused to donate a host FD for directfs, falling back to RPCs: %v", err)
+		return
+	}
+	fs.root.directfs = &directfsDentry{controlFD: hostFD}
+}
+
+// getDirectfsChild opens the file at name in parent on the host and returns a
+// new dentry representing it.
+//
+// Preconditions: parent.directfs != nil.
+func (fs *filesystem) getDirectfsChild(ctx context.Context, parent *dentry, name string) (*dentry, error) {
+	ctx.UninterruptibleSleepStart(false)
+	childFD, stat, err := openAtAndStat(parent.directfs.controlFD, name)
+	ctx.UninterruptibleSleepFinish(false)
+	if err != nil {
+		return nil, err
+	}
+	switch stat.Mode & linux.FileTypeMask {
+	case linux.ModeRegular, linux.ModeDirectory, linux.ModeSymlink:
+	default:
+		// Sockets, pipes and devices are subject to the gofer's host file
+		// policy, which the sentry can't enforce.
+		unix.Close(childFD)
+		return nil, linuxerr.EPERM
+	}
+	child, err := fs.newDentryLisa(ctx, &lisafs.Inode{
+		ControlFD: lisafs.InvalidFDID,
+		Stat:      stat,
+	})
+	if err != nil {
+		unix.Close(childFD)
+		return nil, err
+	}
+	child.directfs = &directfsDentry{controlFD: childFD}
+	return child, nil
+}
+
+// stat returns the statx(2) results for the file.
+func (dd *directfsDentry) stat(ctx context.Context) (linux.Statx, error) {
+	ctx.UninterruptibleSleepStart(false)
+	stat, err := fstatx(dd.controlFD)
+	ctx.UninterruptibleSleepFinish(false)
+	return stat, err
+}
+
+// walkStat is analogous to lisafs.ClientFD.WalkStat. It returns the statx(2)
+// results for each file along names, stopping at the first file that doesn't
+// exist. If names[0] is empty, the first result is for the file itself.
+func (dd *directfsDentry) walkStat(ctx context.Context, names []string) ([]linux.Statx, error) {
+	stats := make([]linux.Statx, 0, len(names))
+	ctx.UninterruptibleSleepStart(false)
+	defer ctx.UninterruptibleSleepFinish(false)
+
+	curFD := dd.controlFD
+	defer func() {
+		if curFD != dd.controlFD {
+			unix.Close(curFD)
+		}
+	}()
+	for i, name := range names {
+		if i == 0 && len(name) == 0 {
+			stat, err := fstatx(curFD)
+			if err != nil {
+				return nil, err
+			}
+			stats = append(stats, stat)
+			continue
+		}
+		childFD, stat, err := openAtAndStat(curFD, name)
+		if err == unix.ENOENT {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if curFD != dd.controlFD {
+			unix.Close(curFD)
+		}
+		curFD = childFD
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// readlink returns the target of the symlink.
+func (dd *directfsDentry) readlink(ctx context.Context) (string, error) {
+	buf := make([]byte, linux.PATH_MAX)
+	ctx.UninterruptibleSleepStart(false)
+	n, err := unix.Readlinkat(dd.controlFD, "", buf)
+	ctx.UninterruptibleSleepFinish(false)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+// statFSTo populates statFS with the statfs(2) results for the filesystem
+// containing the file.
+func (dd *directfsDentry) statFSTo(ctx context.Context, statFS *lisafs.StatFS) error {
+	var s unix.Statfs_t
+	ctx.UninterruptibleSleepStart(false)
+	err := unix.Fstatfs(dd.controlFD, &s)
+	ctx.UninterruptibleSleepFinish(false)
+	if err != nil {
+		return err
+	}
+	*statFS = lisafs.StatFS{
+		Type:            uint64(s.Type),
+		BlockSize:       s.Bsize,
+		Blocks:          s.Blocks,
+		BlocksFree:      s.Bfree,
+		BlocksAvailable: s.Bavail,
+		Files:           s.Files,
+		FilesFree:       s.Ffree,
+		NameLength:      uint64(s.Namelen),
+	}
+	return nil
+}
+
+// dirents returns the entries of the directory, excluding "." and "..".
+func (dd *directfsDentry) dirents(ctx context.Context) ([]lisafs.Dirent64, error) {
+	ctx.UninterruptibleSleepStart(false)
+	defer ctx.UninterruptibleSleepFinish(false)
+
+	// Use a new directory FD so that concurrent readers don't share a file
+	// offset.
+	dirFD, err := unix.Openat(dd.controlFD, ".", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(dirFD)
+
+	var (
+		ds  []lisafs.Dirent64
+		buf [8192]byte
+	)
+	for {
+		n, err := unix.Getdents(dirFD, buf[:])
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return ds, nil
+		}
+		for b := buf[:n]; len(b) > 0; {
+			// See struct linux_dirent64 in include/linux/dirent.h.
+			reclen := hostarch.ByteOrder.Uint16(b[16:18])
+			name := direntName(b[19:reclen])
+			ftype := b[18]
+			ino := hostarch.ByteOrder.Uint64(b[0:8])
+			b = b[reclen:]
+			if name == "." || name == ".." {
+				continue
+			}
+			// Like the gofer, stat each entry to get its device number.
+			childFD, stat, err := openAtAndStat(dirFD, name)
+			if err != nil {
+				log.Warningf("directfs: skipping dirent %q with failed stat: %v", name, err)
+				continue
+			}
+			unix.Close(childFD)
+			ds = append(ds, lisafs.Dirent64{
+				Ino:      primitive.Uint64(ino),
+				DevMinor: primitive.Uint32(stat.DevMinor),
+				DevMajor: primitive.Uint32(stat.DevMajor),
+				Type:     primitive.Uint8(ftype),
+				Name:     lisafs.SizedString(name),
+			})
+		}
+	}
+}
+
+// ensureSharedHandleDirectfs implements dentry.ensureSharedHandle for dentries
+// accessed with directfs.
+//
+// Preconditions:
+//   - d.directfs != nil.
+//   - d.isRegularFile() || d.isDir().
+func (d *dentry) ensureSharedHandleDirectfs(ctx context.Context, write, trunc bool) error {
+	if write || trunc {
+		return linuxerr.EROFS
+	}
+	d.handleMu.Lock()
+	defer d.handleMu.Unlock()
+	if d.readFD.RacyLoad() >= 0 {
+		return nil
+	}
+	ctx.UninterruptibleSleepStart(false)
+	hostFD, err := unix.Openat(procSelfFD, strconv.Itoa(d.directfs.controlFD), unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	ctx.UninterruptibleSleepFinish(false)
+	if err != nil {
+		return err
+	}
+	// There can't be existing mappings of the file since it had no handle,
+	// and the handle is never writable, so it can back all mappings.
+	d.readFD.Store(int32(hostFD))
+	d.mmapFD.Store(int32(hostFD))
+	return nil
+}
+
+// checkDirectfsWrite returns EROFS if d is accessed with directfs. The gofer
+// only donates host FDs for read-only mounts, so such files can't be modified
+// even if the sentry's mount is made writable.
+func (d *dentry) checkDirectfsWrite() error {
+	if d.directfs != nil {
+		return linuxerr.EROFS
+	}
+	return nil
+}
+
+// destroyDirectfs closes d's host FD.
+//
+// Preconditions: d.directfs != nil.
+func (d *dentry) destroyDirectfs() {
+	_ = unix.Close(d.directfs.controlFD)
+	d.directfs = nil
+}
+
+// openAtAndStat opens the file at name in dirFD with O_PATH, without following
+// symlinks, and returns the new FD along with the file's statx(2) results.
+func openAtAndStat(dirFD int, name string) (int, linux.Statx, error) {
+	fd, err := unix.Openat(dirFD, name, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, linux.Statx{}, err
+	}
+	stat, err := fstatx(fd)
+	if err != nil {
+		unix.Close(fd)
+		return -1, linux.Statx{}, err
+	}
+	return fd, stat, nil
+}
+
+// fstatxMask is the set of fields that fstatx requests from the host.
+const fstatxMask = linux.STATX_BASIC_STATS | linux.STATX_BTIME
+
+// fstatx returns the statx(2) results for fd, in the same way as the gofer
+// does. Only fields provided by the host filesystem are set in the returned
+// mask.
+func fstatx(fd int) (linux.Statx, error) {
+	var stat unix.Statx_t
+	if err := unix.Statx(fd, "", unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW, fstatxMask, &stat); err != nil {
+		return linux.Statx{}, err
+	}
+	return linux.Statx{
+		Mask:      stat.Mask & fstatxMask,
+		Mode:      stat.Mode,
+		DevMinor:  stat.Dev_minor,
+		DevMajor:  stat.Dev_major,
+		Ino:       stat.Ino,
+		Nlink:     stat.Nlink,
+		UID:       stat.Uid,
+		GID:       stat.Gid,
+		RdevMinor: stat.Rdev_minor,
+		RdevMajor: stat.Rdev_major,
+		Size:      stat.Size,
+		Blksize:   stat.Blksize,
+		Blocks:    stat.Blocks,
+		Atime:     linux.StatxTimestamp{Sec: stat.Atime.Sec, Nsec: stat.Atime.Nsec},
+		Btime:     linux.StatxTimestamp{Sec: stat.Btime.Sec, Nsec: stat.Btime.Nsec},
+		Ctime:     linux.StatxTimestamp{Sec: stat.Ctime.Sec, Nsec: stat.Ctime.Nsec},
+		Mtime:     linux.StatxTimestamp{Sec: stat.Mtime.Sec, Nsec: stat.Mtime.Nsec},
+	}, nil
+}
+
+// direntName returns the NUL-terminated name in b.
+func direntName(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -90,6 +90,7 @@ func (d *dentry) cacheNegativeLookupLocked(name string) {
 		d.children = make(map[string]*dentry)
 	}
 	d.children[name] = nil
+	negativeDentries.track(d)
 }
 
 type createSyntheticOpts struct {
@@ -221,11 +222,16 @@ func (d *dentry) getDirents(ctx context.Context) ([]vfs.Dirent, error) {
 	// dentry.dirMu.
 	d.fs.renameMu.RLock()
 	defer d.fs.renameMu.RUnlock()
+	if !d.cachedMetadataAuthoritative() {
+		// A delegation allows the dirents read below to be cached.
+		d.fs.delegate(ctx, []*dentry{d})
+	}
 	d.dirMu.Lock()
 	defer d.dirMu.Unlock()
 	if d.dirents != nil {
 		return d.dirents, nil
 	}
+	delegation := d.delegation.Load()
 
 	// It's not clear if 9P2000.L's readdir is expected to return "." and "..",
 	// so we generate them here.
@@ -265,13 +271,25 @@ func (d *dentry) getDirents(ctx context.Context) ([]vfs.Dirent, error) {
 		shouldSeek0 := true
 		for {
 			if d.fs.opts.lisaEnabled {
-				countLisa := int32(count)
-				if shouldSeek0 {
-					// See lisafs.Getdents64Req.Count.
-					countLisa = -countLisa
-					shouldSeek0 = false
+				var (
+					lisafsDs []lisafs.Dirent64
+					err      error
+				)
+				if d.directfs != nil {
+					// All entries are read at once.
+					if shouldSeek0 {
+						lisafsDs, err = d.directfs.dirents(ctx)
+						shouldSeek0 = false
+					}
+				} else {
+					countLisa := int32(count)
+					if shouldSeek0 {
+						// See lisafs.Getdents64Req.Count.
+						countLisa = -countLisa
+						shouldSeek0 = false
+					}
+					lisafsDs, err = d.readFDLisa.Getdents64(ctx, countLisa)
 				}
-				lisafsDs, err := d.readFDLisa.Getdents64(ctx, countLisa)
 				if err != nil {
 					d.handleMu.RUnlock()
 					return nil, err
@@ -355,12 +373,24 @@ func (d *dentry) getDirents(ctx context.Context) ([]vfs.Dirent, error) {
 			})
 		}
 	}
-	// Cache dirents for future directoryFDs if permitted.
-	if d.cachedMetadataAuthoritative() {
+	if d.verity != nil {
+		var err error
+		if dirents, err = d.verifyDirents(dirents); err != nil {
+			return nil, err
+		}
+	}
+	// Cache dirents for future directoryFDs if permitted. If the delegation
+	// held when reading began is recalled, it clears d.dirents after we
+	// release d.dirMu.
+	if d.cachedMetadataAuthoritative() || (delegation != 0 && d.delegation.Load() == delegation) {
 		d.dirents = dirents
-		d.childrenSet = make(map[string]struct{}, len(dirents))
-		for _, dirent := range d.dirents {
-			d.childrenSet[dirent.Name] = struct{}{}
+		// On verity mounts, d.verity.children already records d's children,
+		// and dirents omits tree files that lookups must still find.
+		if d.verity == nil {
+			d.childrenSet = make(map[string]struct{}, len(dirents))
+			for _, dirent := range d.dirents {
+				d.childrenSet[dirent.Name] = struct{}{}
+			}
 		}
 	}
 	return dirents, nil
@@ -0,0 +1,254 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/lisafs"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// File handles on gofer filesystems contain an ID assigned by the sentry,
+// which takes the place of the inode number in a linux.FILEID_INO64_GEN
+// handle. IDs are never reused, so the generation number is always 0.
+//
+// The remote filesystem offers no way to find a file other than by path, so
+// each ID records the file's path at the time its handle was last encoded,
+// updated when this client renames the file or one of its ancestors, along
+// with a key identifying the file on the host. Decoding a handle walks the
+// path and checks that the key still matches, so that handles for deleted or
+// replaced files are stale.
+const fileHandleSize = 12
+
+// fileHandle records the file identified by a file handle ID.
+//
+// +stateify savable
+type fileHandle struct {
+	// key identifies the file on the host.
+	key fileHandleKey
+
+	// path is the path to the file relative to the filesystem root, or the
+	// empty string for the root itself.
+	path string
+
+	// verified is true if key is known to identify the file on the host
+	// after the last restore. Host inode numbers are only stable on the same
+	// host filesystem, so the first successful walk of path after restore
+	// re-learns key instead of checking it.
+	verified bool `state:"nosave"`
+}
+
+// fileHandleKey identifies a file on the host.
+//
+// +stateify savable
+type fileHandleKey struct {
+	inoKey inoKey
+
+	// handleType and handle are the file's host file handle, if the gofer
+	// provided one. Host file handles, unlike inode numbers, include a
+	// generation number that distinguishes a file from a deleted file that
+	// had the same inode number.
+	handleType int32
+	handle     string
+}
+
+// EncodeFileHandle implements vfs.FilesystemImplFileHandleExtension.EncodeFileHandle.
+func (fs *filesystem) EncodeFileHandle(ctx context.Context, vfsd *vfs.Dentry) (int32, []byte, error) {
+	d := vfsd.Impl().(*dentry)
+	if d.isSynthetic() {
+		// Synthetic files don't exist on the remote filesystem, so there is
+		// nothing to find them by after they go out of the dentry tree.
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+	key, err := d.fileHandleKey(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	fs.renameMu.RLock()
+	path := d.fileHandlePathLocked()
+	fs.fileHandleMu.Lock()
+	id, ok := fs.fileHandleByKey[key]
+	if ok {
+		fs.fileHandles[id].path = path
+	} else {
+		fs.lastFileHandle++
+		id = fs.lastFileHandle
+		if fs.fileHandles == nil {
+			fs.fileHandles = make(map[uint64]*fileHandle)
+		}
+		fs.fileHandles[id] = &fileHandle{
+			key:      key,
+			path:     path,
+			verified: true,
+		}
+		fs.fileHandleByKey[key] = id
+	}
+	fs.fileHandleMu.Unlock()
+	fs.renameMu.RUnlock()
+
+	b := make([]byte, fileHandleSize)
+	hostarch.ByteOrder.PutUint64(b, id)
+	return linux.FILEID_INO64_GEN, b, nil
+}
+
+// DecodeFileHandle implements vfs.FilesystemImplFileHandleExtension.DecodeFileHandle.
+func (fs *filesystem) DecodeFileHandle(ctx context.Context, typ int32, b []byte) (*vfs.Dentry, error) {
+	if typ != linux.FILEID_INO64_GEN || len(b) != fileHandleSize || hostarch.ByteOrder.Uint32(b[8:]) != 0 {
+		return nil, linuxerr.ESTALE
+	}
+	id := hostarch.ByteOrder.Uint64(b)
+	fs.fileHandleMu.Lock()
+	fh, ok := fs.fileHandles[id]
+	var path string
+	if ok {
+		path = fh.path
+	}
+	fs.fileHandleMu.Unlock()
+	if !ok {
+		return nil, linuxerr.ESTALE
+	}
+
+	d, err := fs.walkFileHandlePath(ctx, path)
+	if err != nil {
+		if linuxerr.Equals(linuxerr.ENOENT, err) || linuxerr.Equals(linuxerr.ENOTDIR, err) {
+			return nil, linuxerr.ESTALE
+		}
+		return nil, err
+	}
+	key, err := d.fileHandleKey(ctx)
+	if err != nil {
+		d.DecRef(ctx)
+		return nil, err
+	}
+
+	fs.fileHandleMu.Lock()
+	stale := key != fh.key && fh.verified
+	if !stale {
+		if key != fh.key {
+			if fs.fileHandleByKey[fh.key] == id {
+				delete(fs.fileHandleByKey, fh.key)
+			}
+			fh.key = key
+			fs.fileHandleByKey[key] = id
+		}
+		fh.verified = true
+	}
+	fs.fileHandleMu.Unlock()
+	if stale {
+		// The file at path has been replaced.
+		d.DecRef(ctx)
+		return nil, linuxerr.ESTALE
+	}
+	return &d.vfsd, nil
+}
+
+// fileHandleKey returns the key identifying d's file on the host.
+//
+// Preconditions: !d.isSynthetic().
+func (d *dentry) fileHandleKey(ctx context.Context) (fileHandleKey, error) {
+	switch {
+	case !d.fs.opts.lisaEnabled:
+		// 9P QID paths are the only stable identifiers available.
+		return fileHandleKey{inoKey: inoKey{ino: d.qidPath}}, nil
+	case d.directfs != nil || !d.fs.clientLisa.IsSupported(lisafs.NameToHandle):
+		return fileHandleKey{inoKey: d.inoKey}, nil
+	}
+	resp, err := d.controlFDLisa.NameToHandle(ctx)
+	if err != nil {
+		return fileHandleKey{}, err
+	}
+	return fileHandleKey{
+		inoKey: inoKey{
+			ino:      resp.Ino,
+			devMinor: resp.DevMinor,
+			devMajor: resp.DevMajor,
+		},
+		handleType: resp.HandleType,
+		handle:     string(resp.Handle[:resp.HandleBytes]),
+	}, nil
+}
+
+// fileHandlePathLocked returns the path to d relative to the filesystem root.
+//
+// Preconditions: d.fs.renameMu must be locked.
+func (d *dentry) fileHandlePathLocked() string {
+	var names []string
+	for ; d.parent != nil; d = d.parent {
+		names = append(names, d.name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, "/")
+}
+
+// walkFileHandlePath returns the dentry at the given path relative to the
+// filesystem root, with a reference taken on it. Cached dentries are not
+// revalidated; the caller is expected to check the returned file's key.
+func (fs *filesystem) walkFileHandlePath(ctx context.Context, path string) (*dentry, error) {
+	var ds *[]*dentry
+	fs.renameMu.RLock()
+	defer fs.renameMuRUnlockAndCheckCaching(ctx, &ds)
+	d := fs.root
+	if path != "" {
+		for _, name := range strings.Split(path, "/") {
+			if !d.isDir() {
+				return nil, linuxerr.ENOTDIR
+			}
+			d.dirMu.Lock()
+			child, err := fs.getChildLocked(ctx, d, name, &ds)
+			d.dirMu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			d = child
+		}
+	}
+	d.IncRef()
+	// Call d.checkCachingLocked() so it can be removed from the cache if needed.
+	ds = appendDentry(ds, d)
+	return d, nil
+}
+
+// renameFileHandlesLocked updates the paths recorded for file handles after
+// the file at oldPath is renamed to newPath.
+//
+// Preconditions: fs.renameMu must be locked for writing.
+func (fs *filesystem) renameFileHandlesLocked(oldPath, newPath string) {
+	fs.fileHandleMu.Lock()
+	defer fs.fileHandleMu.Unlock()
+	for _, fh := range fs.fileHandles {
+		if fh.path == oldPath {
+			fh.path = newPath
+		} else if strings.HasPrefix(fh.path, oldPath+"/") {
+			fh.path = newPath + fh.path[len(oldPath):]
+		}
+	}
+}
+
+// restoreFileHandles rebuilds fs.fileHandleByKey after restore.
+func (fs *filesystem) restoreFileHandles() {
+	fs.fileHandleMu.Lock()
+	defer fs.fileHandleMu.Unlock()
+	fs.fileHandleByKey = make(map[fileHandleKey]uint64, len(fs.fileHandles))
+	for id, fh := range fs.fileHandles {
+		fs.fileHandleByKey[fh.key] = id
+	}
+}
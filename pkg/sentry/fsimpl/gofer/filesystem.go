@@ -15,6 +15,7 @@
 package gofer
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math"
 	"strings"
@@ -269,8 +270,15 @@ func (fs *filesystem) getChildAndWalkPathLocked(ctx context.Context, parent *den
 	if len(first) > MaxFilenameLen {
 		return nil, linuxerr.ENAMETOOLONG
 	}
+	if parent.verity != nil {
+		// Each component must be verified, so walk one component at a time.
+		return fs.getChildLocked(ctx, parent, first, ds)
+	}
 	if child, ok := parent.children[first]; ok || parent.isSynthetic() {
 		if child == nil {
+			if ok {
+				parent.touchNegativeLookups()
+			}
 			return nil, linuxerr.ENOENT
 		}
 		return child, nil
@@ -283,6 +291,11 @@ func (fs *filesystem) getChildAndWalkPathLocked(ctx context.Context, parent *den
 		}
 	}
 
+	if parent.directfs != nil {
+		// There is no RPC to save, walk one component at a time.
+		return fs.getChildLocked(ctx, parent, first, ds)
+	}
+
 	// Walk as much of the path as possible in 1 RPC.
 	names := []string{first}
 	for pit = pit.Next(); pit.Ok(); pit = pit.Next() {
@@ -369,8 +382,22 @@ func (fs *filesystem) getChildLocked(ctx context.Context, parent *dentry, name s
 	if len(name) > MaxFilenameLen {
 		return nil, linuxerr.ENAMETOOLONG
 	}
+	if parent.verity != nil {
+		return fs.getVerityChildLocked(ctx, parent, name, ds)
+	}
+	return fs.lookupChildLocked(ctx, parent, name, ds)
+}
+
+// lookupChildLocked is getChildLocked without verification of the child on
+// verity mounts.
+//
+// Preconditions: Same as getChildLocked, and len(name) <= MaxFilenameLen.
+func (fs *filesystem) lookupChildLocked(ctx context.Context, parent *dentry, name string, ds **[]*dentry) (*dentry, error) {
 	if child, ok := parent.children[name]; ok || parent.isSynthetic() {
 		if child == nil {
+			if ok {
+				parent.touchNegativeLookups()
+			}
 			return nil, linuxerr.ENOENT
 		}
 		return child, nil
@@ -384,7 +411,16 @@ func (fs *filesystem) getChildLocked(ctx context.Context, parent *dentry, name s
 	}
 
 	var child *dentry
-	if fs.opts.lisaEnabled {
+	if parent.directfs != nil {
+		var err error
+		child, err = fs.getDirectfsChild(ctx, parent, name)
+		if err != nil {
+			if linuxerr.Equals(linuxerr.ENOENT, err) {
+				parent.cacheNegativeLookupLocked(name)
+			}
+			return nil, err
+		}
+	} else if fs.opts.lisaEnabled {
 		childInode, err := parent.controlFDLisa.Walk(ctx, name)
 		if err != nil {
 			if linuxerr.Equals(linuxerr.ENOENT, err) {
@@ -456,9 +492,20 @@ func (fs *filesystem) walkParentDirLocked(ctx context.Context, rp *vfs.Resolving
 //
 // Preconditions: fs.renameMu must be locked.
 func (fs *filesystem) resolveLocked(ctx context.Context, rp *vfs.ResolvingPath, ds **[]*dentry) (*dentry, error) {
+	return fs.resolveMaybeRevalidateLocked(ctx, rp, true /* revalidate */, ds)
+}
+
+// resolveMaybeRevalidateLocked is equivalent to resolveLocked, except that
+// cached dentries are not revalidated if revalidate is false. Files that are
+// not cached are still looked up on the remote filesystem.
+//
+// Preconditions: fs.renameMu must be locked.
+func (fs *filesystem) resolveMaybeRevalidateLocked(ctx context.Context, rp *vfs.ResolvingPath, revalidate bool, ds **[]*dentry) (*dentry, error) {
 	d := rp.Start().Impl().(*dentry)
-	if err := fs.revalidatePath(ctx, rp, d, ds); err != nil {
-		return nil, err
+	if revalidate {
+		if err := fs.revalidatePath(ctx, rp, d, ds); err != nil {
+			return nil, err
+		}
 	}
 	for !rp.Done() {
 		d.dirMu.Lock()
@@ -468,7 +515,7 @@ func (fs *filesystem) resolveLocked(ctx context.Context, rp *vfs.ResolvingPath,
 			return nil, err
 		}
 		d = next
-		if followedSymlink {
+		if followedSymlink && revalidate {
 			if err := fs.revalidatePath(ctx, rp, d, ds); err != nil {
 				return nil, err
 			}
@@ -549,6 +596,12 @@ func (fs *filesystem) doCreateAt(ctx context.Context, rp *vfs.ResolvingPath, dir
 		return err
 	}
 	defer mnt.EndWrite()
+	if err := parent.checkDirectfsWrite(); err != nil {
+		return err
+	}
+	if err := parent.checkVerityWrite(); err != nil {
+		return err
+	}
 
 	if err := parent.checkPermissions(rp.Credentials(), vfs.MayWrite); err != nil {
 		// Existence check takes precedence.
@@ -573,7 +626,7 @@ func (fs *filesystem) doCreateAt(ctx context.Context, rp *vfs.ResolvingPath, dir
 		if dir {
 			ev |= linux.IN_ISDIR
 		}
-		parent.watches.Notify(ctx, name, uint32(ev), 0, vfs.InodeEvent, false /* unlinked */)
+		parent.notify(ctx, name, uint32(ev), 0, vfs.InodeEvent, false /* unlinked */)
 		return nil
 	}
 	// No cached dentry exists; however, in InteropModeShared there might still be
@@ -582,6 +635,7 @@ func (fs *filesystem) doCreateAt(ctx context.Context, rp *vfs.ResolvingPath, dir
 	if err := createInRemoteDir(parent, name, &ds); err != nil {
 		return err
 	}
+	parent.breakDelegationLocked()
 	if fs.opts.interop != InteropModeShared {
 		if child, ok := parent.children[name]; ok && child == nil {
 			// Delete the now-stale negative dentry.
@@ -594,7 +648,7 @@ func (fs *filesystem) doCreateAt(ctx context.Context, rp *vfs.ResolvingPath, dir
 	if dir {
 		ev |= linux.IN_ISDIR
 	}
-	parent.watches.Notify(ctx, name, uint32(ev), 0, vfs.InodeEvent, false /* unlinked */)
+	parent.notify(ctx, name, uint32(ev), 0, vfs.InodeEvent, false /* unlinked */)
 	return nil
 }
 
@@ -615,6 +669,12 @@ func (fs *filesystem) unlinkAt(ctx context.Context, rp *vfs.ResolvingPath, dir b
 		return err
 	}
 	defer rp.Mount().EndWrite()
+	if err := parent.checkDirectfsWrite(); err != nil {
+		return err
+	}
+	if err := parent.checkVerityWrite(); err != nil {
+		return err
+	}
 
 	name := rp.Component()
 	if dir {
@@ -750,13 +810,9 @@ func (fs *filesystem) unlinkAt(ctx context.Context, rp *vfs.ResolvingPath, dir b
 
 	// Generate inotify events for rmdir or unlink.
 	if dir {
-		parent.watches.Notify(ctx, name, linux.IN_DELETE|linux.IN_ISDIR, 0, vfs.InodeEvent, true /* unlinked */)
+		parent.notify(ctx, name, linux.IN_DELETE|linux.IN_ISDIR, 0, vfs.InodeEvent, true /* unlinked */)
 	} else {
-		var cw *vfs.Watches
-		if child != nil {
-			cw = &child.watches
-		}
-		vfs.InotifyRemoveChild(ctx, cw, &parent.watches, name)
+		inotifyRemoveChild(ctx, child, parent, name)
 	}
 
 	if child != nil {
@@ -769,6 +825,7 @@ func (fs *filesystem) unlinkAt(ctx context.Context, rp *vfs.ResolvingPath, dir b
 		ds = appendDentry(ds, child)
 	}
 	parent.cacheNegativeLookupLocked(name)
+	parent.breakDelegationLocked()
 	if parent.cachedMetadataAuthoritative() {
 		parent.clearDirentsLocked()
 		parent.touchCMtime()
@@ -852,17 +909,19 @@ func (fs *filesystem) LinkAt(ctx context.Context, rp *vfs.ResolvingPath, vd vfs.
 		if err := vfs.MayLink(rp.Credentials(), mode, uid, gid); err != nil {
 			return err
 		}
-		if d.nlink.Load() == 0 {
+		if d.nlink.Load() == 0 && d.tmpfileLinkable.Load() == 0 {
 			return linuxerr.ENOENT
 		}
 		if d.nlink.Load() == math.MaxUint32 {
 			return linuxerr.EMLINK
 		}
 		if fs.opts.lisaEnabled {
-			linkInode, err := parent.controlFDLisa.LinkAt(ctx, d.controlFDLisa.ID(), childName)
+			linkInode, err := parent.controlFDLisa.LinkAt(ctx, d.controlFDLisa, childName)
 			if err != nil {
 				return err
 			}
+			// d's link count has changed.
+			d.delegatedAt.Store(0)
 			return parent.insertCreatedChildLocked(ctx, &linkInode, childName, nil, ds)
 		}
 		return parent.file.link(ctx, d.file, childName)
@@ -870,7 +929,14 @@ func (fs *filesystem) LinkAt(ctx context.Context, rp *vfs.ResolvingPath, vd vfs.
 
 	if err == nil {
 		// Success!
-		vd.Dentry().Impl().(*dentry).incLinks()
+		d := vd.Dentry().Impl().(*dentry)
+		if d.tmpfileLinkable.Swap(0) != 0 {
+			// d was an unnamed file created by open(O_TMPFILE); it now has
+			// exactly one link.
+			d.nlink.Store(1)
+		} else {
+			d.incLinks()
+		}
 	}
 	return err
 }
@@ -887,17 +953,20 @@ func (fs *filesystem) MkdirAt(ctx context.Context, rp *vfs.ResolvingPath, opts v
 			kgid = auth.KGID(parent.gid.Load())
 			mode |= linux.S_ISGID
 		}
-		var err error
+		ruid, rgid, err := fs.remoteOwner(creds.EffectiveKUID, kgid)
+		if err != nil {
+			return err
+		}
 		if fs.opts.lisaEnabled {
 			var childDirInode lisafs.Inode
-			childDirInode, err = parent.controlFDLisa.MkdirAt(ctx, name, mode, lisafs.UID(creds.EffectiveKUID), lisafs.GID(kgid))
+			childDirInode, err = parent.controlFDLisa.MkdirAt(ctx, name, mode, lisafs.UID(ruid), lisafs.GID(rgid))
 			if err == nil {
 				if err = parent.insertCreatedChildLocked(ctx, &childDirInode, name, nil, ds); err != nil {
 					return err
 				}
 			}
 		} else {
-			_, err = parent.file.mkdir(ctx, name, p9.FileMode(mode), (p9.UID)(creds.EffectiveKUID), p9.GID(kgid))
+			_, err = parent.file.mkdir(ctx, name, p9.FileMode(mode), (p9.UID)(ruid), p9.GID(rgid))
 		}
 		if err == nil {
 			if fs.opts.interop != InteropModeShared {
@@ -945,7 +1014,14 @@ func (fs *filesystem) MknodAt(ctx context.Context, rp *vfs.ResolvingPath, opts v
 		if fs.opts.lisaEnabled {
 			err = parent.mknodLisaLocked(ctx, name, creds, opts, ds)
 		} else {
-			_, err = parent.file.mknod(ctx, name, (p9.FileMode)(opts.Mode), opts.DevMajor, opts.DevMinor, (p9.UID)(creds.EffectiveKUID), (p9.GID)(creds.EffectiveKGID))
+			var (
+				ruid auth.KUID
+				rgid auth.KGID
+			)
+			if ruid, rgid, err = fs.remoteOwner(creds.EffectiveKUID, creds.EffectiveKGID); err != nil {
+				return err
+			}
+			_, err = parent.file.mknod(ctx, name, (p9.FileMode)(opts.Mode), opts.DevMajor, opts.DevMinor, (p9.UID)(ruid), (p9.GID)(rgid))
 		}
 		if err == nil {
 			return nil
@@ -996,12 +1072,8 @@ func (fs *filesystem) MknodAt(ctx context.Context, rp *vfs.ResolvingPath, opts v
 
 // OpenAt implements vfs.FilesystemImpl.OpenAt.
 func (fs *filesystem) OpenAt(ctx context.Context, rp *vfs.ResolvingPath, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
-	// Reject O_TMPFILE, which is not supported; supporting it correctly in the
-	// presence of other remote filesystem users requires remote filesystem
-	// support, and it isn't clear that there's any way to implement this in
-	// 9P.
 	if opts.Flags&linux.O_TMPFILE != 0 {
-		return nil, linuxerr.EOPNOTSUPP
+		return fs.openTmpfile(ctx, rp, &opts)
 	}
 	mayCreate := opts.Flags&linux.O_CREAT != 0
 	mustCreate := opts.Flags&(linux.O_CREAT|linux.O_EXCL) == (linux.O_CREAT | linux.O_EXCL)
@@ -1098,6 +1170,114 @@ afterTrailingSymlink:
 	return child.open(ctx, rp, &opts)
 }
 
+// openTmpfile implements OpenAt for O_TMPFILE, creating an unnamed regular
+// file in the directory at rp.
+func (fs *filesystem) openTmpfile(ctx context.Context, rp *vfs.ResolvingPath, opts *vfs.OpenOptions) (*vfs.FileDescription, error) {
+	// Supporting O_TMPFILE correctly in the presence of other remote
+	// filesystem users requires remote filesystem support, which only lisafs
+	// servers provide.
+	if !fs.opts.lisaEnabled || !fs.clientLisa.IsSupported(lisafs.OpenTmpfileAt) {
+		return nil, linuxerr.EOPNOTSUPP
+	}
+
+	var ds *[]*dentry
+	fs.renameMu.RLock()
+	defer fs.renameMuRUnlockAndCheckCaching(ctx, &ds)
+	d, err := fs.resolveLocked(ctx, rp, &ds)
+	if err != nil {
+		return nil, err
+	}
+	if !d.isDir() {
+		return nil, linuxerr.ENOTDIR
+	}
+	if d.isSynthetic() {
+		return nil, linuxerr.EOPNOTSUPP
+	}
+	creds := rp.Credentials()
+	if err := d.checkPermissions(creds, vfs.MayWrite|vfs.MayExec); err != nil {
+		return nil, err
+	}
+	if d.isDeleted() {
+		return nil, linuxerr.ENOENT
+	}
+	mnt := rp.Mount()
+	if err := mnt.CheckBeginWrite(); err != nil {
+		return nil, err
+	}
+	defer mnt.EndWrite()
+	if err := d.checkDirectfsWrite(); err != nil {
+		return nil, err
+	}
+	if err := d.checkVerityWrite(); err != nil {
+		return nil, err
+	}
+
+	// If the directory is setgid, use its GID rather than the caller's.
+	kgid := creds.EffectiveKGID
+	if d.mode.Load()&linux.S_ISGID != 0 {
+		kgid = auth.KGID(d.gid.Load())
+	}
+	ruid, rgid, err := fs.remoteOwner(creds.EffectiveKUID, kgid)
+	if err != nil {
+		return nil, err
+	}
+	ino, openFD, hostFD, err := d.controlFDLisa.OpenTmpfileAt(ctx, opts.Flags&(linux.O_ACCMODE|linux.O_EXCL), opts.Mode, lisafs.UID(ruid), lisafs.GID(rgid))
+	if err != nil {
+		return nil, err
+	}
+	child, err := fs.newDentryLisa(ctx, &ino)
+	if err != nil {
+		fs.clientLisa.CloseFD(ctx, ino.ControlFD, false /* flush */)
+		fs.clientLisa.CloseFD(ctx, openFD, false /* flush */)
+		if hostFD >= 0 {
+			unix.Close(hostFD)
+		}
+		return nil, err
+	}
+
+	// The new file has no name, so it isn't one of d's children, but it
+	// still holds a reference on d like an unlinked file would.
+	d.IncRef()
+	child.parent = d
+	child.setDeleted()
+	if opts.Flags&linux.O_EXCL == 0 {
+		child.tmpfileLinkable.Store(1)
+	}
+	appendNewChildDentry(&ds, d, child)
+
+	useRegularFileFD := child.fileType() == linux.S_IFREG && !fs.opts.regularFilesUseSpecialFileFD
+	if useRegularFileFD {
+		child.handleMu.Lock()
+		if vfs.MayReadFileWithOpenFlags(opts.Flags) {
+			child.readFDLisa = fs.clientLisa.NewFD(openFD)
+			if hostFD != -1 {
+				child.readFD = atomicbitops.FromInt32(int32(hostFD))
+				child.mmapFD = atomicbitops.FromInt32(int32(hostFD))
+			}
+		}
+		if vfs.MayWriteFileWithOpenFlags(opts.Flags) {
+			child.writeFDLisa = fs.clientLisa.NewFD(openFD)
+			child.writeFD = atomicbitops.FromInt32(int32(hostFD))
+		}
+		child.handleMu.Unlock()
+		fd, err := newRegularFileFD(mnt, child, opts.Flags)
+		if err != nil {
+			return nil, err
+		}
+		return &fd.vfsfd, nil
+	}
+	h := handle{
+		fdLisa: fs.clientLisa.NewFD(openFD),
+		fd:     int32(hostFD),
+	}
+	fd, err := newSpecialFileFD(h, mnt, child, opts.Flags)
+	if err != nil {
+		h.close(ctx)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
 // Preconditions: The caller must hold no locks (since opening pipes may block
 // indefinitely).
 func (d *dentry) open(ctx context.Context, rp *vfs.ResolvingPath, opts *vfs.OpenOptions) (*vfs.FileDescription, error) {
@@ -1107,6 +1287,11 @@ func (d *dentry) open(ctx context.Context, rp *vfs.ResolvingPath, opts *vfs.Open
 	}
 
 	trunc := opts.Flags&linux.O_TRUNC != 0 && d.fileType() == linux.S_IFREG
+	if trunc || (ats.MayWrite() && d.isRegularFile()) {
+		if err := d.checkVerityWrite(); err != nil {
+			return nil, err
+		}
+	}
 	if trunc {
 		// Lock metadataMu *while* we open a regular file with O_TRUNC because
 		// open(2) will change the file size on server.
@@ -1295,6 +1480,12 @@ func (d *dentry) createAndOpenChildLocked(ctx context.Context, rp *vfs.Resolving
 		return nil, err
 	}
 	defer mnt.EndWrite()
+	if err := d.checkDirectfsWrite(); err != nil {
+		return nil, err
+	}
+	if err := d.checkVerityWrite(); err != nil {
+		return nil, err
+	}
 
 	creds := rp.Credentials()
 	name := rp.Component()
@@ -1304,13 +1495,17 @@ func (d *dentry) createAndOpenChildLocked(ctx context.Context, rp *vfs.Resolving
 	if d.mode.Load()&linux.S_ISGID != 0 {
 		kgid = auth.KGID(d.gid.Load())
 	}
+	ruid, rgid, err := d.fs.remoteOwner(creds.EffectiveKUID, kgid)
+	if err != nil {
+		return nil, err
+	}
 
 	var child *dentry
 	var openP9File p9file
 	openLisaFD := lisafs.InvalidFDID
 	openHostFD := int32(-1)
 	if d.fs.opts.lisaEnabled {
-		ino, openFD, hostFD, err := d.controlFDLisa.OpenCreateAt(ctx, name, opts.Flags&linux.O_ACCMODE, opts.Mode, lisafs.UID(creds.EffectiveKUID), lisafs.GID(kgid))
+		ino, openFD, hostFD, err := d.controlFDLisa.OpenCreateAt(ctx, name, opts.Flags&linux.O_ACCMODE, opts.Mode, lisafs.UID(ruid), lisafs.GID(rgid))
 		if err != nil {
 			return nil, err
 		}
@@ -1337,7 +1532,7 @@ func (d *dentry) createAndOpenChildLocked(ctx context.Context, rp *vfs.Resolving
 		// We only want the access mode for creating the file.
 		createFlags := p9.OpenFlags(opts.Flags) & p9.OpenFlagsModeMask
 
-		fdobj, openFile, createQID, _, err := dirfile.create(ctx, name, createFlags, p9.FileMode(opts.Mode), (p9.UID)(creds.EffectiveKUID), p9.GID(kgid))
+		fdobj, openFile, createQID, _, err := dirfile.create(ctx, name, createFlags, p9.FileMode(opts.Mode), (p9.UID)(ruid), p9.GID(rgid))
 		if err != nil {
 			dirfile.close(ctx)
 			return nil, err
@@ -1392,6 +1587,7 @@ func (d *dentry) createAndOpenChildLocked(ctx context.Context, rp *vfs.Resolving
 	// Insert the dentry into the tree.
 	d.cacheNewChildLocked(child, name)
 	appendNewChildDentry(ds, d, child)
+	d.breakDelegationLocked()
 	if d.cachedMetadataAuthoritative() {
 		d.touchCMtime()
 		d.clearDirentsLocked()
@@ -1418,7 +1614,7 @@ func (d *dentry) createAndOpenChildLocked(ctx context.Context, rp *vfs.Resolving
 		}
 		childVFSFD = &fd.vfsfd
 	}
-	d.watches.Notify(ctx, name, linux.IN_CREATE, 0, vfs.PathEvent, false /* unlinked */)
+	d.notify(ctx, name, linux.IN_CREATE, 0, vfs.PathEvent, false /* unlinked */)
 	return childVFSFD, nil
 }
 
@@ -1477,6 +1673,15 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 	defer mnt.EndWrite()
 
 	oldParent := oldParentVD.Dentry().Impl().(*dentry)
+	if err := oldParent.checkDirectfsWrite(); err != nil {
+		return err
+	}
+	if err := newParent.checkDirectfsWrite(); err != nil {
+		return err
+	}
+	if err := newParent.checkVerityWrite(); err != nil {
+		return err
+	}
 	if !oldParent.cachedMetadataAuthoritative() {
 		if err := oldParent.updateFromGetattr(ctx); err != nil {
 			return err
@@ -1567,7 +1772,7 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 	// Update the remote filesystem.
 	if !renamed.isSynthetic() {
 		if fs.opts.lisaEnabled {
-			err = oldParent.controlFDLisa.RenameAt(ctx, oldName, newParent.controlFDLisa.ID(), newName)
+			err = oldParent.controlFDLisa.RenameAt(ctx, oldName, newParent.controlFDLisa, newName)
 		} else {
 			err = renamed.file.rename(ctx, newParent.file, newName)
 		}
@@ -1594,6 +1799,7 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 	}
 
 	// Update the dentry tree.
+	oldPath := renamed.fileHandlePathLocked()
 	vfsObj.CommitRenameReplaceDentry(ctx, &renamed.vfsd, replacedVFSD)
 	if replaced != nil {
 		replaced.setDeleted()
@@ -1623,6 +1829,18 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 		newParent.children = make(map[string]*dentry)
 	}
 	newParent.children[newName] = renamed
+	fs.renameFileHandlesLocked(oldPath, renamed.fileHandlePathLocked())
+
+	// Stop relying on delegations for the changed directories and the
+	// renamed file, since their recalls may not have arrived yet.
+	oldParent.breakDelegationLocked()
+	newParent.breakDelegationLocked()
+	renamed.delegatedAt.Store(0)
+	if renamed.isDir() {
+		renamed.dirMu.Lock()
+		renamed.breakDelegationLocked()
+		renamed.dirMu.Unlock()
+	}
 
 	// Update metadata.
 	if renamed.cachedMetadataAuthoritative() {
@@ -1643,7 +1861,7 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 			newParent.incLinks()
 		}
 	}
-	vfs.InotifyRename(ctx, &renamed.watches, &oldParent.watches, &newParent.watches, oldName, newName, renamed.isDir())
+	inotifyRename(ctx, renamed, oldParent, newParent, oldName, newName)
 	return nil
 }
 
@@ -1678,7 +1896,9 @@ func (fs *filesystem) StatAt(ctx context.Context, rp *vfs.ResolvingPath, opts vf
 	var ds *[]*dentry
 	fs.renameMu.RLock()
 	defer fs.renameMuRUnlockAndCheckCaching(ctx, &ds)
-	d, err := fs.resolveLocked(ctx, rp, &ds)
+	// AT_STATX_DONT_SYNC permits returning cached metadata, so don't
+	// revalidate cached dentries with the remote filesystem.
+	d, err := fs.resolveMaybeRevalidateLocked(ctx, rp, opts.Sync != linux.AT_STATX_DONT_SYNC, &ds)
 	if err != nil {
 		return linux.Statx{}, err
 	}
@@ -1705,7 +1925,13 @@ func (fs *filesystem) StatFSAt(ctx context.Context, rp *vfs.ResolvingPath) (linu
 	}
 	if fs.opts.lisaEnabled {
 		var statFS lisafs.StatFS
-		if err := d.controlFDLisa.StatFSTo(ctx, &statFS); err != nil {
+		var err error
+		if d.directfs != nil {
+			err = d.directfs.statFSTo(ctx, &statFS)
+		} else {
+			err = d.controlFDLisa.StatFSTo(ctx, &statFS)
+		}
+		if err != nil {
 			return linux.Statfs{}, err
 		}
 		if statFS.NameLength == 0 || statFS.NameLength > MaxFilenameLen {
@@ -1754,8 +1980,12 @@ func (fs *filesystem) StatFSAt(ctx context.Context, rp *vfs.ResolvingPath) (linu
 func (fs *filesystem) SymlinkAt(ctx context.Context, rp *vfs.ResolvingPath, target string) error {
 	return fs.doCreateAt(ctx, rp, false /* dir */, func(parent *dentry, name string, ds **[]*dentry) error {
 		creds := rp.Credentials()
+		ruid, rgid, err := fs.remoteOwner(creds.EffectiveKUID, creds.EffectiveKGID)
+		if err != nil {
+			return err
+		}
 		if fs.opts.lisaEnabled {
-			symlinkInode, err := parent.controlFDLisa.SymlinkAt(ctx, name, target, lisafs.UID(creds.EffectiveKUID), lisafs.GID(creds.EffectiveKGID))
+			symlinkInode, err := parent.controlFDLisa.SymlinkAt(ctx, name, target, lisafs.UID(ruid), lisafs.GID(rgid))
 			if err != nil {
 				return err
 			}
@@ -1768,7 +1998,7 @@ func (fs *filesystem) SymlinkAt(ctx context.Context, rp *vfs.ResolvingPath, targ
 				}
 			}, ds)
 		}
-		_, err := parent.file.symlink(ctx, target, name, (p9.UID)(creds.EffectiveKUID), (p9.GID)(creds.EffectiveKGID))
+		_, err = parent.file.symlink(ctx, target, name, (p9.UID)(ruid), (p9.GID)(rgid))
 		return err
 	}, nil)
 }
@@ -1903,7 +2133,13 @@ func (fs *filesystem) MountOptions() string {
 
 	switch fs.opts.interop {
 	case InteropModeExclusive:
-		optsKV = append(optsKV, mopt{moptCache, cacheFSCache})
+		if fs.opts.writeback {
+			optsKV = append(optsKV, mopt{moptCache, cacheFSCacheWriteback})
+			optsKV = append(optsKV, mopt{moptDirtyBytes, fs.opts.dirtyBytes})
+			optsKV = append(optsKV, mopt{moptDirtyExpire, fs.opts.dirtyExpire})
+		} else {
+			optsKV = append(optsKV, mopt{moptCache, cacheFSCache})
+		}
 	case InteropModeWritethrough:
 		optsKV = append(optsKV, mopt{moptCache, cacheFSCacheWritethrough})
 	case InteropModeShared:
@@ -1925,6 +2161,12 @@ func (fs *filesystem) MountOptions() string {
 	if fs.opts.lisaEnabled {
 		optsKV = append(optsKV, mopt{moptLisafs, nil})
 	}
+	if fs.opts.verityRootHash != nil {
+		optsKV = append(optsKV, mopt{moptVerity, hex.EncodeToString(fs.opts.verityRootHash)})
+	}
+	if fs.opts.readaheadBytes != defaultReadaheadBytes {
+		optsKV = append(optsKV, mopt{moptReadaheadBytes, fs.opts.readaheadBytes})
+	}
 
 	opts := make([]string, 0, len(optsKV))
 	for _, opt := range optsKV {
@@ -22,14 +22,22 @@
 //	    dentry.cachingMu
 //	      dentryCache.mu
 //	      dentry.dirMu
+//	        negativeDentryCache.mu
 //	        filesystem.syncMu
+//	        filesystem.delegationsMu
+//	        filesystem.fileHandleMu
 //	        dentry.metadataMu
 //	          *** "memmap.Mappable locks" below this point
 //	          dentry.mapsMu
 //	            *** "memmap.Mappable locks taken by Translate" below this point
 //	            dentry.handleMu
 //	              dentry.dataMu
+//	                filePageCache.mu
 //	          filesystem.inoMu
+//	writeback.flushMu
+//	  dentry.handleMu
+//	    dentry.dataMu
+//	      writeback.mu
 //	specialFileFD.mu
 //	  specialFileFD.bufMu
 //
@@ -39,10 +47,13 @@
 package gofer
 
 import (
+	"encoding/hex"
 	"fmt"
+	"math"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -52,6 +63,7 @@ import (
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/lisafs"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/merkletree"
 	"gvisor.dev/gvisor/pkg/p9"
 	refs_vfs1 "gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/refsvfs2"
@@ -62,6 +74,7 @@ import (
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/shrinker"
 	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -86,6 +99,12 @@ const (
 	moptLimitHostFDTranslation = "limit_host_fd_translation"
 	moptOverlayfsStaleRead     = "overlayfs_stale_read"
 	moptLisafs                 = "lisafs"
+	moptDirectfs               = "directfs"
+	moptHostSHM                = "host_shm"
+	moptVerity                 = "verity"
+	moptDirtyBytes             = "dirty_bytes"
+	moptDirtyExpire            = "dirty_expire"
+	moptReadaheadBytes         = "readahead_bytes"
 )
 
 // Valid values for the "cache" mount option.
@@ -93,6 +112,7 @@ const (
 	cacheNone                = "none"
 	cacheFSCache             = "fscache"
 	cacheFSCacheWritethrough = "fscache_writethrough"
+	cacheFSCacheWriteback    = "fscache_writeback"
 	cacheRemoteRevalidating  = "remote_revalidating"
 )
 
@@ -109,6 +129,11 @@ type dentryCache struct {
 	dentriesLen uint64
 	// maxCachedDentries is the maximum number of cachable dentries.
 	maxCachedDentries uint64
+	// registrations is the number of filesystems that have registered the
+	// cache with package shrinker. unregister undoes the registration while
+	// registrations is non-zero.
+	registrations int    `state:"nosave"`
+	unregister    func() `state:"nosave"`
 }
 
 // SetDentryCacheSize sets the size of the global gofer dentry cache.
@@ -205,8 +230,47 @@ type filesystem struct {
 	// savedDentryRW records open read/write handles during save/restore.
 	savedDentryRW map[*dentry]savedDentryRW
 
+	// If delegationsEnabled is non-zero, the server recalls delegations
+	// granted to this client, so that directories may be delegated. See
+	// delegation.go.
+	delegationsEnabled atomicbitops.Uint32 `state:"nosave"`
+
+	// delegations maps the control FDs of directories that hold or have
+	// requested a delegation to their dentries. lastDelegation is the
+	// generation number of the last delegation granted. Delegations are not
+	// preserved across checkpoint/restore because FDIDs are not. These fields
+	// are protected by delegationsMu.
+	delegationsMu  sync.Mutex              `state:"nosave"`
+	delegations    map[lisafs.FDID]*dentry `state:"nosave"`
+	lastDelegation uint64                  `state:"nosave"`
+
+	// fileHandles maps the IDs encoded in file handles to the files they
+	// identify, and lastFileHandle is the last ID assigned. They are preserved
+	// across checkpoint/restore so that handles remain valid. fileHandleByKey
+	// is the inverse of fileHandles, and is rebuilt on restore. These fields
+	// are protected by fileHandleMu. See file_handle.go.
+	fileHandleMu    sync.Mutex `state:"nosave"`
+	fileHandles     map[uint64]*fileHandle
+	fileHandleByKey map[fileHandleKey]uint64 `state:"nosave"`
+	lastFileHandle  uint64
+
 	// released is nonzero once filesystem.Release has been called.
 	released atomicbitops.Int32
+
+	// dentryCacheRegistered is true if fs holds a registration of dentryCache
+	// with package shrinker.
+	dentryCacheRegistered bool `state:"nosave"`
+
+	// wb writes back dirty cached pages if opts.writeback is true, and is nil
+	// otherwise. See writeback.go.
+	wb *writeback `state:"nosave"`
+
+	// readaheadBytes is the amount of data read ahead of sequential readers
+	// and not yet read, which is limited to opts.readaheadBytes.
+	readaheadBytes atomicbitops.Uint64 `state:"nosave"`
+
+	// readaheads tracks goroutines reading ahead. See readahead.go.
+	readaheads sync.WaitGroup `state:"nosave"`
 }
 
 // +stateify savable
@@ -253,6 +317,39 @@ type filesystemOptions struct {
 	// lisaEnabled indicates whether the client will use lisafs protocol to
 	// communicate with the server instead of 9P.
 	lisaEnabled bool
+
+	// If directfs is true, the client asks the server for host FDs and
+	// accesses files directly with host syscalls where possible. The server
+	// only provides them for read-only mounts. directfs requires lisaEnabled.
+	directfs bool
+
+	// If hostSHM is true, regular files on the filesystem are shared memory
+	// files that are also mapped by processes outside the sandbox. All
+	// application memory mappings of such files map host pages through host
+	// FDs, and saving the filesystem fails if this can't be preserved across
+	// restore. hostSHM requires InteropModeShared.
+	hostSHM bool
+
+	// If verityRootHash is not nil, the filesystem is a read-only verity
+	// mount, and all files are verified against the Merkle trees measured by
+	// "runsc verity-measure", whose root hash is verityRootHash. See
+	// verity.go. verityRootHash implies forcePageCache, and is not supported
+	// with InteropModeShared.
+	verityRootHash []byte
+
+	// If writeback is true, writes to regular files fill the page cache and
+	// are written back to the remote file asynchronously, once the
+	// filesystem holds more than dirtyBytes of dirty data or a file's data
+	// has been dirty for dirtyExpire. writeback requires InteropModeExclusive
+	// and implies forcePageCache. See writeback.go.
+	writeback   bool
+	dirtyBytes  uint64
+	dirtyExpire time.Duration
+
+	// readaheadBytes is the maximum amount of data read ahead of sequential
+	// readers that the filesystem may hold. If readaheadBytes is 0, readahead
+	// is disabled. See readahead.go.
+	readaheadBytes uint64
 }
 
 // InteropMode controls the client's interaction with other remote filesystem
@@ -333,6 +430,24 @@ type InternalFilesystemOptions struct {
 	// If OpenSocketsByConnecting is true, silently translate attempts to open
 	// files identifying as sockets to connect RPCs.
 	OpenSocketsByConnecting bool
+
+	// If UIDMappings or GIDMappings is non-empty, the filesystem is an
+	// idmapped mount: each entry presents file owners (or groups) in the
+	// range starting at FirstParentID on the remote filesystem as the range
+	// starting at FirstID. IDs that aren't mapped are presented as the
+	// overflow ID, and can't be assigned to files.
+	UIDMappings []auth.IDMapEntry
+	GIDMappings []auth.IDMapEntry
+
+	// If ReconnectTimeout is non-zero, the filesystem survives the loss of its
+	// connection to the server: operations wait up to ReconnectTimeout for a
+	// new server FD to be passed to Reconnect. This is only supported with
+	// lisafs.
+	ReconnectTimeout time.Duration
+
+	// ContainerID is the ID of the container that the filesystem belongs to.
+	// Together with UniqueID, it identifies the filesystem to Reconnect.
+	ContainerID string
 }
 
 // _V9FS_DEFUID and _V9FS_DEFGID (from Linux's fs/9p/v9fs.h) are the default
@@ -390,6 +505,12 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 			fsopts.interop = InteropModeExclusive
 		case cacheFSCacheWritethrough:
 			fsopts.interop = InteropModeWritethrough
+		case cacheFSCacheWriteback:
+			fsopts.interop = InteropModeExclusive
+			fsopts.writeback = true
+			// Dirty pages must be held in the sentry's page cache, so host
+			// FDs can't be used for application memory mappings.
+			fsopts.forcePageCache = true
 		case cacheNone:
 			fsopts.regularFilesUseSpecialFileFD = true
 			fallthrough
@@ -466,9 +587,62 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 			return nil, nil, linuxerr.EINVAL
 		}
 	}
+	if _, ok := mopts[moptDirectfs]; ok {
+		delete(mopts, moptDirectfs)
+		fsopts.directfs = true
+	}
+	if _, ok := mopts[moptHostSHM]; ok {
+		delete(mopts, moptHostSHM)
+		fsopts.hostSHM = true
+	}
+	if rootHash, ok := mopts[moptVerity]; ok {
+		delete(mopts, moptVerity)
+		fsopts.verityRootHash, err = hex.DecodeString(rootHash)
+		if err != nil || len(fsopts.verityRootHash) != merkletree.DigestSize {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid verity root hash: %s=%s", moptVerity, rootHash)
+			return nil, nil, linuxerr.EINVAL
+		}
+		// Verification happens when the page cache is filled, so host FDs
+		// can't be used for application memory mappings.
+		fsopts.forcePageCache = true
+	}
 	// fsopts.regularFilesUseSpecialFileFD can only be enabled by specifying
 	// "cache=none".
 
+	// Parse the write-back thresholds.
+	fsopts.dirtyBytes = defaultDirtyBytes
+	if dirtyBytesStr, ok := mopts[moptDirtyBytes]; ok {
+		delete(mopts, moptDirtyBytes)
+		dirtyBytes, err := strconv.ParseUint(dirtyBytesStr, 10, 64)
+		if err != nil || dirtyBytes == 0 || !fsopts.writeback {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid dirty byte limit (requires cache=%s): %s=%s", cacheFSCacheWriteback, moptDirtyBytes, dirtyBytesStr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		fsopts.dirtyBytes = dirtyBytes
+	}
+	fsopts.dirtyExpire = defaultDirtyExpire
+	if dirtyExpireStr, ok := mopts[moptDirtyExpire]; ok {
+		delete(mopts, moptDirtyExpire)
+		dirtyExpire, err := time.ParseDuration(dirtyExpireStr)
+		if err != nil || dirtyExpire <= 0 || !fsopts.writeback {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid dirty expiry time (requires cache=%s): %s=%s", cacheFSCacheWriteback, moptDirtyExpire, dirtyExpireStr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		fsopts.dirtyExpire = dirtyExpire
+	}
+
+	// Parse the readahead limit.
+	fsopts.readaheadBytes = defaultReadaheadBytes
+	if readaheadBytesStr, ok := mopts[moptReadaheadBytes]; ok {
+		delete(mopts, moptReadaheadBytes)
+		readaheadBytes, err := strconv.ParseUint(readaheadBytesStr, 10, 64)
+		if err != nil {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid readahead byte limit: %s=%s", moptReadaheadBytes, readaheadBytesStr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		fsopts.readaheadBytes = readaheadBytes
+	}
+
 	// Check for unparsed options.
 	if len(mopts) != 0 {
 		ctx.Warningf("gofer.FilesystemType.GetFilesystem: unknown options: %v", mopts)
@@ -484,6 +658,24 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		ctx.Warningf("gofer.FilesystemType.GetFilesystem: regularFilesUseSpecialFileFD and overlayfsStaleRead options are not supported together.")
 		return nil, nil, linuxerr.EINVAL
 	}
+	if fsopts.directfs && (!fsopts.lisaEnabled || fsopts.regularFilesUseSpecialFileFD) {
+		// Files accessed with directfs don't have lisafs FDs, and only support
+		// the shared handles used by regular file descriptions.
+		ctx.Warningf("gofer.FilesystemType.GetFilesystem: directfs requires lisafs and is not supported with regularFilesUseSpecialFileFD.")
+		return nil, nil, linuxerr.EINVAL
+	}
+	if fsopts.hostSHM && (fsopts.interop != InteropModeShared || fsopts.forcePageCache) {
+		// Memory mappings are only coherent with processes outside the sandbox
+		// if they never use the sentry's page cache.
+		ctx.Warningf("gofer.FilesystemType.GetFilesystem: host_shm requires cache=remote_revalidating and is not supported with force_page_cache.")
+		return nil, nil, linuxerr.EINVAL
+	}
+	if fsopts.verityRootHash != nil && fsopts.interop == InteropModeShared {
+		// Files are only verified when they are first looked up, so the
+		// client must not observe remote changes after that.
+		ctx.Warningf("gofer.FilesystemType.GetFilesystem: verity is not supported with cache=remote_revalidating or cache=none.")
+		return nil, nil, linuxerr.EINVAL
+	}
 
 	// Handle internal options.
 	iopts, ok := opts.InternalData.(InternalFilesystemOptions)
@@ -499,21 +691,23 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		return nil, nil, err
 	}
 	fs := &filesystem{
-		mfp:          mfp,
-		opts:         fsopts,
-		iopts:        iopts,
-		clock:        ktime.RealtimeClockFromContext(ctx),
-		devMinor:     devMinor,
-		inoByQIDPath: make(map[uint64]uint64),
-		inoByKey:     make(map[inoKey]uint64),
+		mfp:             mfp,
+		opts:            fsopts,
+		iopts:           iopts,
+		clock:           ktime.RealtimeClockFromContext(ctx),
+		devMinor:        devMinor,
+		inoByQIDPath:    make(map[uint64]uint64),
+		inoByKey:        make(map[inoKey]uint64),
+		fileHandleByKey: make(map[fileHandleKey]uint64),
 	}
 
 	// Did the user configure a global dentry cache?
 	if globalDentryCache != nil {
 		fs.dentryCache = globalDentryCache
 	} else {
-		fs.dentryCache = &dentryCache{maxCachedDentries: defaultMaxCachedDentries}
+		fs.dentryCache = &dentryCache{maxCachedDentries: maxCachedDentriesPerMount}
 	}
+	fs.registerDentryCache()
 
 	fs.vfsfs.Init(vfsObj, &fstype, fs)
 
@@ -521,6 +715,16 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		fs.vfsfs.DecRef(ctx)
 		return nil, nil, err
 	}
+	fs.registerReconnectable()
+	if fs.opts.writeback {
+		fs.startWriteback()
+	}
+	if fs.opts.verityRootHash != nil {
+		if err := fs.initVerityRoot(ctx); err != nil {
+			fs.vfsfs.DecRef(ctx)
+			return nil, nil, err
+		}
+	}
 
 	return &fs.vfsfs, &fs.root.vfsd, nil
 }
@@ -536,6 +740,8 @@ func (fs *filesystem) initClientAndRoot(ctx context.Context) error {
 		fs.root, err = fs.newDentryLisa(ctx, &rootInode)
 		if err != nil {
 			fs.clientLisa.CloseFD(ctx, rootInode.ControlFD, false /* flush */)
+		} else if fs.opts.directfs {
+			fs.initDirectfsRoot(ctx)
 		}
 	} else {
 		fs.root, err = fs.initClient(ctx)
@@ -563,6 +769,10 @@ func (fs *filesystem) initClientLisa(ctx context.Context) (lisafs.Inode, error)
 	if err != nil {
 		return lisafs.Inode{}, err
 	}
+	if fs.iopts.ReconnectTimeout > 0 {
+		fs.clientLisa.EnableReconnect(&rootInode, fs.iopts.ReconnectTimeout, fs.onDisconnect)
+	}
+	fs.initDelegations()
 	if fs.opts.aname == "/" {
 		return rootInode, nil
 	}
@@ -688,6 +898,11 @@ func (fs *filesystem) dial(ctx context.Context) error {
 // Release implements vfs.FilesystemImpl.Release.
 func (fs *filesystem) Release(ctx context.Context) {
 	fs.released.Store(1)
+	fs.unregisterReconnectable()
+	fs.unregisterDentryCache()
+	if fs.wb != nil {
+		fs.wb.stop()
+	}
 
 	mf := fs.mfp.MemoryFile()
 	fs.syncMu.Lock()
@@ -705,6 +920,7 @@ func (fs *filesystem) Release(ctx context.Context) {
 		// Discard cached pages.
 		d.cache.DropAll(mf)
 		d.dirty.RemoveAll()
+		d.updateCachedBytesLocked()
 		d.dataMu.Unlock()
 		// Close host FDs if they exist. We can use RacyLoad() because d.handleMu
 		// is locked.
@@ -846,10 +1062,33 @@ type dentry struct {
 	// only files that can be synthetic are sockets, pipes, and directories.
 	controlFDLisa lisafs.ClientFD `state:"nosave"`
 
+	// If directfs is not nil, this dentry is accessed with host syscalls on
+	// directfs.controlFD rather than with RPCs. In that case, controlFDLisa is
+	// only valid for the root dentry. directfs is immutable.
+	directfs *directfsDentry `state:"nosave"`
+
 	// If deleted is non-zero, the file represented by this dentry has been
 	// deleted is accessed using atomic memory operations.
 	deleted atomicbitops.Uint32
 
+	// If tmpfileLinkable is non-zero, this dentry represents a file created by
+	// open(O_TMPFILE) without O_EXCL that has not yet been linked, so LinkAt
+	// may give it a name even though its link count is 0. tmpfileLinkable is
+	// accessed using atomic memory operations.
+	tmpfileLinkable atomicbitops.Uint32
+
+	// If this dentry represents a directory and delegation is non-zero, the
+	// server has delegated the directory to this client, and delegation is the
+	// delegation's generation number. delegation is only mutated with
+	// filesystem.delegationsMu locked, and accessed using atomic memory
+	// operations.
+	delegation atomicbitops.Uint64 `state:"nosave"`
+
+	// delegatedAt is the generation number of the delegation held by this
+	// dentry's parent when its metadata was last fetched for revalidation, or
+	// zero if there was none. It is accessed using atomic memory operations.
+	delegatedAt atomicbitops.Uint64 `state:"nosave"`
+
 	// cachingMu is used to synchronize concurrent dentry caching attempts on
 	// this dentry.
 	cachingMu sync.Mutex `state:"nosave"`
@@ -884,6 +1123,11 @@ type dentry struct {
 	// syntheticChildren is protected by dirMu.
 	syntheticChildren int
 
+	// negativeUse is the time at which a negative lookup was last cached in,
+	// or served from, children. It orders directories for eviction of
+	// negative lookups under memory pressure.
+	negativeUse atomicbitops.Int64 `state:"nosave"`
+
 	// If this dentry represents a directory,
 	// dentry.cachedMetadataAuthoritative() == true, and dirents is not nil, it
 	// is a cache of all entries in the directory, in the order they were
@@ -907,7 +1151,8 @@ type dentry struct {
 	uid        atomicbitops.Uint32 // auth.KUID, but stored as raw uint32 for sync/atomic
 	gid        atomicbitops.Uint32 // auth.KGID, but ...
 	blockSize  atomicbitops.Uint32 // 0 if unknown
-	// Timestamps, all nsecs from the Unix epoch.
+	// Timestamps, all nsecs from the Unix epoch. btime is 0 if the remote
+	// filesystem doesn't provide file creation times.
 	atime atomicbitops.Int64
 	mtime atomicbitops.Int64
 	ctime atomicbitops.Int64
@@ -982,10 +1227,24 @@ type dentry struct {
 	// protected by dataMu.
 	cache fsutil.FileRangeSet
 
+	// cachedBytes is the number of bytes in cache, as accounted in
+	// filePages. cachedBytes is protected by dataMu.
+	cachedBytes uint64 `state:"nosave"`
+
+	// cacheUse is the time at which cache was last accessed by a read or
+	// write. It orders files for eviction of cached data.
+	cacheUse atomicbitops.Int64 `state:"nosave"`
+
 	// If this dentry represents a regular file that is client-cached, dirty
 	// tracks dirty segments in cache. dirty is protected by dataMu.
 	dirty fsutil.DirtySet
 
+	// If this dentry represents a regular file that is client-cached,
+	// evicted tracks segments that were evicted from cache, for cachestat(2).
+	// Only the ranges in evicted are meaningful; since it's a DirtySet, they
+	// are marked as dirty. evicted is protected by dataMu.
+	evicted fsutil.DirtySet
+
 	// pf implements platform.File for mappings of hostFD.
 	pf dentryPlatformFile
 
@@ -995,6 +1254,11 @@ type dentry struct {
 	haveTarget bool
 	target     string
 
+	// If the filesystem is a verity mount, verity is the verified state of
+	// this dentry. verity is nil until the dentry has been verified, and
+	// immutable thereafter; it is set with the parent's dirMu locked.
+	verity *verityState
+
 	// If this dentry represents a synthetic socket file, endpoint is the
 	// transport endpoint bound to this file.
 	endpoint transport.BoundEndpoint
@@ -1071,10 +1335,10 @@ func (fs *filesystem) newDentry(ctx context.Context, file p9file, qid p9.QID, ma
 	d.cacheEntry.d = d
 	d.syncableListEntry.d = d
 	if mask.UID {
-		d.uid = atomicbitops.FromUint32(dentryUIDFromP9UID(attr.UID))
+		d.uid = atomicbitops.FromUint32(fs.dentryUIDFromP9UID(attr.UID))
 	}
 	if mask.GID {
-		d.gid = atomicbitops.FromUint32(dentryGIDFromP9GID(attr.GID))
+		d.gid = atomicbitops.FromUint32(fs.dentryGIDFromP9GID(attr.GID))
 	}
 	if mask.Size {
 		d.size = atomicbitops.FromUint64(attr.Size)
@@ -1146,10 +1410,10 @@ func (fs *filesystem) newDentryLisa(ctx context.Context, ino *lisafs.Inode) (*de
 	d.cacheEntry.d = d
 	d.syncableListEntry.d = d
 	if ino.Stat.Mask&linux.STATX_UID != 0 {
-		d.uid = atomicbitops.FromUint32(dentryUIDFromLisaUID(lisafs.UID(ino.Stat.UID)))
+		d.uid = atomicbitops.FromUint32(fs.dentryUIDFromLisaUID(lisafs.UID(ino.Stat.UID)))
 	}
 	if ino.Stat.Mask&linux.STATX_GID != 0 {
-		d.gid = atomicbitops.FromUint32(dentryGIDFromLisaGID(lisafs.GID(ino.Stat.GID)))
+		d.gid = atomicbitops.FromUint32(fs.dentryGIDFromLisaGID(lisafs.GID(ino.Stat.GID)))
 	}
 	if ino.Stat.Mask&linux.STATX_SIZE != 0 {
 		d.size = atomicbitops.FromUint64(ino.Stat.Size)
@@ -1240,10 +1504,10 @@ func (d *dentry) updateFromP9AttrsLocked(mask p9.AttrMask, attr *p9.Attr) {
 		d.mode.Store(uint32(attr.Mode))
 	}
 	if mask.UID {
-		d.uid.Store(dentryUIDFromP9UID(attr.UID))
+		d.uid.Store(d.fs.dentryUIDFromP9UID(attr.UID))
 	}
 	if mask.GID {
-		d.gid.Store(dentryGIDFromP9GID(attr.GID))
+		d.gid.Store(d.fs.dentryGIDFromP9GID(attr.GID))
 	}
 	// There is no P9_GETATTR_* bit for I/O block size.
 	if attr.BlockSize != 0 {
@@ -1285,10 +1549,10 @@ func (d *dentry) updateFromLisaStatLocked(stat *linux.Statx) {
 		d.mode.Store(uint32(stat.Mode))
 	}
 	if stat.Mask&linux.STATX_UID != 0 {
-		d.uid.Store(dentryUIDFromLisaUID(lisafs.UID(stat.UID)))
+		d.uid.Store(d.fs.dentryUIDFromLisaUID(lisafs.UID(stat.UID)))
 	}
 	if stat.Mask&linux.STATX_GID != 0 {
-		d.gid.Store(dentryGIDFromLisaGID(lisafs.GID(stat.GID)))
+		d.gid.Store(d.fs.dentryGIDFromLisaGID(lisafs.GID(stat.GID)))
 	}
 	if stat.Blksize != 0 {
 		d.blockSize.Store(stat.Blksize)
@@ -1360,6 +1624,15 @@ func (d *dentry) updateFromGetattr(ctx context.Context) error {
 //
 // +checklocks:d.metadataMu
 func (d *dentry) updateFromStatLisaLocked(ctx context.Context, fdLisa *lisafs.ClientFD) error {
+	if d.directfs != nil {
+		stat, err := d.directfs.stat(ctx)
+		if err != nil {
+			return err
+		}
+		d.updateFromLisaStatLocked(&stat)
+		return nil
+	}
+
 	handleMuRLocked := false
 	if fdLisa == nil {
 		// Use open FDs in preferenece to the control FD. This may be significantly
@@ -1440,7 +1713,7 @@ func (d *dentry) fileType() uint32 {
 }
 
 func (d *dentry) statTo(stat *linux.Statx) {
-	stat.Mask = linux.STATX_TYPE | linux.STATX_MODE | linux.STATX_NLINK | linux.STATX_UID | linux.STATX_GID | linux.STATX_ATIME | linux.STATX_MTIME | linux.STATX_CTIME | linux.STATX_INO | linux.STATX_SIZE | linux.STATX_BLOCKS | linux.STATX_BTIME
+	stat.Mask = linux.STATX_TYPE | linux.STATX_MODE | linux.STATX_NLINK | linux.STATX_UID | linux.STATX_GID | linux.STATX_ATIME | linux.STATX_MTIME | linux.STATX_CTIME | linux.STATX_INO | linux.STATX_SIZE | linux.STATX_BLOCKS
 	stat.Blksize = d.blockSize.Load()
 	stat.Nlink = d.nlink.Load()
 	if stat.Nlink == 0 {
@@ -1460,7 +1733,10 @@ func (d *dentry) statTo(stat *linux.Statx) {
 	// as having no holes.
 	stat.Blocks = (stat.Size + 511) / 512
 	stat.Atime = linux.NsecToStatxTimestamp(d.atime.Load())
-	stat.Btime = linux.NsecToStatxTimestamp(d.btime.Load())
+	if btime := d.btime.Load(); btime != 0 {
+		stat.Mask |= linux.STATX_BTIME
+		stat.Btime = linux.NsecToStatxTimestamp(btime)
+	}
 	stat.Ctime = linux.NsecToStatxTimestamp(d.ctime.Load())
 	stat.Mtime = linux.NsecToStatxTimestamp(d.mtime.Load())
 	stat.DevMajor = linux.UNNAMED_MAJOR
@@ -1479,10 +1755,31 @@ func (d *dentry) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs
 	if err := vfs.CheckSetStat(ctx, creds, opts, mode, auth.KUID(d.uid.Load()), auth.KGID(d.gid.Load())); err != nil {
 		return err
 	}
+	// The server is sent the owner and group as stored on the remote
+	// filesystem.
+	remoteUID, remoteGID := auth.KUID(stat.UID), auth.KGID(stat.GID)
+	if stat.Mask&linux.STATX_UID != 0 {
+		var err error
+		if remoteUID, err = d.fs.remoteUID(remoteUID); err != nil {
+			return err
+		}
+	}
+	if stat.Mask&linux.STATX_GID != 0 {
+		var err error
+		if remoteGID, err = d.fs.remoteGID(remoteGID); err != nil {
+			return err
+		}
+	}
 	if err := mnt.CheckBeginWrite(); err != nil {
 		return err
 	}
 	defer mnt.EndWrite()
+	if err := d.checkDirectfsWrite(); err != nil {
+		return err
+	}
+	if err := d.checkVerityWrite(); err != nil {
+		return err
+	}
 
 	if stat.Mask&linux.STATX_SIZE != 0 {
 		// Reject attempts to truncate files other than regular files, since
@@ -1555,8 +1852,11 @@ func (d *dentry) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs
 				d.dataMu.Lock()
 			}
 			if d.fs.opts.lisaEnabled {
+				remoteStat := *stat
+				remoteStat.UID = uint32(remoteUID)
+				remoteStat.GID = uint32(remoteGID)
 				var err error
-				failureMask, failureErr, err = d.controlFDLisa.SetStat(ctx, stat)
+				failureMask, failureErr, err = d.controlFDLisa.SetStat(ctx, &remoteStat)
 				if err != nil {
 					if stat.Mask&linux.STATX_SIZE != 0 {
 						d.dataMu.Unlock() // +checklocksforce: locked conditionally above
@@ -1575,8 +1875,8 @@ func (d *dentry) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs
 					MTimeNotSystemTime: stat.Mask&linux.STATX_MTIME != 0 && stat.Mtime.Nsec != linux.UTIME_NOW,
 				}, p9.SetAttr{
 					Permissions:      p9.FileMode(stat.Mode),
-					UID:              p9.UID(stat.UID),
-					GID:              p9.GID(stat.GID),
+					UID:              p9.UID(remoteUID),
+					GID:              p9.GID(remoteGID),
 					Size:             stat.Size,
 					ATimeSeconds:     uint64(stat.Atime.Sec),
 					ATimeNanoSeconds: uint64(stat.Atime.Nsec),
@@ -1605,6 +1905,12 @@ func (d *dentry) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs
 			// it'll be overwritten by revalidation before the next time it's
 			// used anyway. (InteropModeShared inhibits client caching of
 			// regular file data, so there's no cache to truncate either.)
+			// Metadata vouched for by a delegation isn't revalidated, though,
+			// and the server's recall may only arrive later.
+			d.delegatedAt.Store(0)
+			if d.delegation.Load() != 0 {
+				return d.updateFromStatLisaLocked(ctx, nil)
+			}
 			return nil
 		}
 	}
@@ -1644,8 +1950,12 @@ func (d *dentry) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs
 // - d.isDir().
 // - fs.opts.lisaEnabled.
 func (d *dentry) mknodLisaLocked(ctx context.Context, name string, creds *auth.Credentials, opts vfs.MknodOptions, ds **[]*dentry) error {
+	kuid, kgid, err := d.fs.remoteOwner(creds.EffectiveKUID, creds.EffectiveKGID)
+	if err != nil {
+		return err
+	}
 	if _, ok := opts.Endpoint.(transport.HostBoundEndpoint); !ok {
-		childInode, err := d.controlFDLisa.MknodAt(ctx, name, opts.Mode, lisafs.UID(creds.EffectiveKUID), lisafs.GID(creds.EffectiveKGID), opts.DevMinor, opts.DevMajor)
+		childInode, err := d.controlFDLisa.MknodAt(ctx, name, opts.Mode, lisafs.UID(kuid), lisafs.GID(kgid), opts.DevMinor, opts.DevMajor)
 		if err != nil {
 			return err
 		}
@@ -1654,7 +1964,7 @@ func (d *dentry) mknodLisaLocked(ctx context.Context, name string, creds *auth.C
 
 	// This mknod(2) is coming from unix bind(2), as opts.Endpoint is set.
 	sockType := opts.Endpoint.(transport.Endpoint).Type()
-	childInode, boundSocketFD, err := d.controlFDLisa.BindAt(ctx, sockType, name, opts.Mode, lisafs.UID(creds.EffectiveKUID), lisafs.GID(creds.EffectiveKGID))
+	childInode, boundSocketFD, err := d.controlFDLisa.BindAt(ctx, sockType, name, opts.Mode, lisafs.UID(kuid), lisafs.GID(kgid))
 	if err != nil {
 		return err
 	}
@@ -1677,23 +1987,133 @@ func (d *dentry) mknodLisaLocked(ctx context.Context, name string, creds *auth.C
 	return nil
 }
 
-// doAllocate performs an allocate operation on d. Note that d.metadataMu will
-// be held when allocate is called.
-func (d *dentry) doAllocate(ctx context.Context, offset, length uint64, allocate func() error) error {
+// doAllocate performs an allocate operation with the given fallocate(2) mode
+// on d. Note that d.metadataMu and d.handleMu will be held when allocate is
+// called.
+func (d *dentry) doAllocate(ctx context.Context, mode, offset, length uint64, allocate func() error) error {
 	d.metadataMu.Lock()
 	defer d.metadataMu.Unlock()
 
+	switch {
+	case mode&(linux.FALLOC_FL_PUNCH_HOLE|linux.FALLOC_FL_ZERO_RANGE) != 0:
+		return d.allocateZeroLocked(ctx, mode, offset, length, allocate)
+	case mode&(linux.FALLOC_FL_COLLAPSE_RANGE|linux.FALLOC_FL_INSERT_RANGE) != 0:
+		return d.allocateShiftLocked(ctx, mode, offset, length, allocate)
+	}
+
 	// Allocating a smaller size is a noop.
 	size := offset + length
 	if d.cachedMetadataAuthoritative() && size <= d.size.RacyLoad() {
 		return nil
 	}
 
+	d.handleMu.RLock()
 	err := allocate()
+	d.handleMu.RUnlock()
 	if err != nil {
 		return err
 	}
-	d.updateSizeLocked(size)
+	if mode&linux.FALLOC_FL_KEEP_SIZE == 0 {
+		d.updateSizeLocked(size)
+	}
+	if d.cachedMetadataAuthoritative() {
+		d.touchCMtimeLocked()
+	}
+	return nil
+}
+
+// allocateZeroLocked performs a FALLOC_FL_PUNCH_HOLE or FALLOC_FL_ZERO_RANGE
+// allocate operation on d, zeroing cached data in the affected range.
+//
+// Preconditions: d.metadataMu must be locked.
+func (d *dentry) allocateZeroLocked(ctx context.Context, mode, offset, length uint64, allocate func() error) error {
+	// Hold d.dataMu across the remote operation so that dirty cached data in
+	// the range can't be written back over it, and so that the cache can't
+	// be refilled with data from before it.
+	d.handleMu.RLock()
+	d.dataMu.Lock()
+	if err := allocate(); err != nil {
+		d.dataMu.Unlock()
+		d.handleMu.RUnlock()
+		return err
+	}
+	end := offset + length
+	freed, _ := d.cache.Punch(memmap.MappableRange{offset, end}, d.fs.mfp.MemoryFile())
+	if freed.Length() != 0 {
+		d.dirty.KeepClean(freed)
+		d.updateCachedBytesLocked()
+	}
+	d.handleMu.RUnlock()
+	if mode&linux.FALLOC_FL_KEEP_SIZE == 0 && end > d.size.RacyLoad() {
+		d.updateSizeAndUnlockDataMuLocked(end)
+	} else {
+		d.dataMu.Unlock()
+	}
+
+	// Invalidate translations of freed pages, so that subsequent accesses
+	// fault in zeroed pages. Compare Linux's mm/truncate.c:
+	// truncate_pagecache_range() => mm/memory.c:unmap_mapping_range(
+	// evencows=0).
+	if freed.Length() != 0 {
+		d.mapsMu.Lock()
+		d.mappings.Invalidate(freed, memmap.InvalidateOpts{})
+		d.mapsMu.Unlock()
+	}
+	if d.cachedMetadataAuthoritative() {
+		d.touchCMtimeLocked()
+	}
+	return nil
+}
+
+// allocateShiftLocked performs a FALLOC_FL_COLLAPSE_RANGE or
+// FALLOC_FL_INSERT_RANGE allocate operation on d, which shifts file data
+// after offset. Whether these are supported depends on the remote
+// filesystem.
+//
+// Preconditions: d.metadataMu must be locked.
+func (d *dentry) allocateShiftLocked(ctx context.Context, mode, offset, length uint64, allocate func() error) error {
+	// Cached data after offset will be at the wrong position once the
+	// remote file's data is shifted, so write it back and drop it.
+	mf := d.fs.mfp.MemoryFile()
+	d.handleMu.RLock()
+	d.dataMu.Lock()
+	if h := d.writeHandleLocked(); h.isOpen() {
+		if err := fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), mf, h.writeFromBlocksAt); err != nil {
+			d.dataMu.Unlock()
+			d.handleMu.RUnlock()
+			return err
+		}
+	}
+	if err := allocate(); err != nil {
+		d.dataMu.Unlock()
+		d.handleMu.RUnlock()
+		return err
+	}
+	shifted := memmap.MappableRange{hostarch.PageRoundDown(offset), hostarch.PageRoundDown(math.MaxUint64)}
+	d.cache.Drop(shifted, mf)
+	d.dirty.KeepClean(shifted)
+	d.updateCachedBytesLocked()
+	d.handleMu.RUnlock()
+	newSize := d.size.RacyLoad()
+	if mode&linux.FALLOC_FL_COLLAPSE_RANGE != 0 {
+		if newSize < length {
+			// Only possible if d.size is stale.
+			newSize = length
+		}
+		newSize -= length
+	} else {
+		newSize += length
+	}
+	d.updateSizeAndUnlockDataMuLocked(newSize)
+
+	// Compare Linux's fs/ext4/extents.c:ext4_collapse_range() =>
+	// mm/truncate.c:truncate_pagecache() => mm/memory.c:
+	// unmap_mapping_range(evencows=1).
+	d.mapsMu.Lock()
+	d.mappings.Invalidate(shifted, memmap.InvalidateOpts{
+		InvalidatePrivate: true,
+	})
+	d.mapsMu.Unlock()
 	if d.cachedMetadataAuthoritative() {
 		d.touchCMtimeLocked()
 	}
@@ -1739,6 +2159,7 @@ func (d *dentry) updateSizeAndUnlockDataMuLocked(newSize uint64) {
 		d.dataMu.Lock()
 		d.cache.Truncate(newSize, d.fs.mfp.MemoryFile())
 		d.dirty.KeepClean(memmap.MappableRange{newSize, oldpgend})
+		d.updateCachedBytesLocked()
 		d.dataMu.Unlock()
 	}
 }
@@ -1750,13 +2171,12 @@ func (d *dentry) checkPermissions(creds *auth.Credentials, ats vfs.AccessTypes)
 func (d *dentry) checkXattrPermissions(creds *auth.Credentials, name string, ats vfs.AccessTypes) error {
 	// Deny access to the "security" and "system" namespaces since applications
 	// may expect these to affect kernel behavior in unimplemented ways
-	// (b/148380782). Allow all other extended attributes to be passed through
-	// to the remote filesystem. This is inconsistent with Linux's 9p client,
-	// but consistent with other filesystems (e.g. FUSE).
-	//
-	// NOTE(b/202533394): Also disallow "trusted" namespace for now. This is
-	// consistent with the VFS1 gofer client.
-	if strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX) || strings.HasPrefix(name, linux.XATTR_SYSTEM_PREFIX) || strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) {
+	// (b/148380782). The exception are file capabilities, which are
+	// implemented by execve(2). Allow all other extended attributes to be
+	// passed through to the remote filesystem, which decides whether they
+	// are supported. This is inconsistent with Linux's 9p client, but
+	// consistent with other filesystems (e.g. FUSE).
+	if (strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX) && name != linux.XATTR_NAME_CAPS) || strings.HasPrefix(name, linux.XATTR_SYSTEM_PREFIX) {
 		return linuxerr.EOPNOTSUPP
 	}
 	mode := linux.FileMode(d.mode.Load())
@@ -1778,32 +2198,32 @@ func (d *dentry) mayDelete(creds *auth.Credentials, child *dentry) error {
 	)
 }
 
-func dentryUIDFromP9UID(uid p9.UID) uint32 {
+func (fs *filesystem) dentryUIDFromP9UID(uid p9.UID) uint32 {
 	if !uid.Ok() {
 		return uint32(auth.OverflowUID)
 	}
-	return uint32(uid)
+	return fs.mountUID(uint32(uid))
 }
 
-func dentryGIDFromP9GID(gid p9.GID) uint32 {
+func (fs *filesystem) dentryGIDFromP9GID(gid p9.GID) uint32 {
 	if !gid.Ok() {
 		return uint32(auth.OverflowGID)
 	}
-	return uint32(gid)
+	return fs.mountGID(uint32(gid))
 }
 
-func dentryUIDFromLisaUID(uid lisafs.UID) uint32 {
+func (fs *filesystem) dentryUIDFromLisaUID(uid lisafs.UID) uint32 {
 	if !uid.Ok() {
 		return uint32(auth.OverflowUID)
 	}
-	return uint32(uid)
+	return fs.mountUID(uint32(uid))
 }
 
-func dentryGIDFromLisaGID(gid lisafs.GID) uint32 {
+func (fs *filesystem) dentryGIDFromLisaGID(gid lisafs.GID) uint32 {
 	if !gid.Ok() {
 		return uint32(auth.OverflowGID)
 	}
-	return uint32(gid)
+	return fs.mountGID(uint32(gid))
 }
 
 // IncRef implements vfs.DentryImpl.IncRef.
@@ -1880,14 +2300,18 @@ func (d *dentry) InotifyWithParent(ctx context.Context, events, cookie uint32, e
 	d.fs.renameMu.RLock()
 	// The ordering below is important, Linux always notifies the parent first.
 	if d.parent != nil {
-		d.parent.watches.Notify(ctx, d.name, events, cookie, et, d.isDeleted())
+		d.parent.notify(ctx, d.name, events, cookie, et, d.isDeleted())
 	}
-	d.watches.Notify(ctx, "", events, cookie, et, d.isDeleted())
+	d.notify(ctx, "", events, cookie, et, d.isDeleted())
 	d.fs.renameMu.RUnlock()
 }
 
 // Watches implements vfs.DentryImpl.Watches.
+//
+// Watches is only called by VFS to add and remove watches, so d is registered
+// in watchedDentries here.
 func (d *dentry) Watches() *vfs.Watches {
+	d.registerWatches()
 	return &d.watches
 }
 
@@ -1895,6 +2319,9 @@ func (d *dentry) Watches() *vfs.Watches {
 //
 // If no watches are left on this dentry and it has no references, cache it.
 func (d *dentry) OnZeroWatches(ctx context.Context) {
+	if d.watches.Size() == 0 {
+		d.unregisterWatches()
+	}
 	d.checkCachingLocked(ctx, false /* renameMuWriteLocked */)
 }
 
@@ -2138,6 +2565,12 @@ func (d *dentry) destroyLocked(ctx context.Context) {
 	// scalability.
 	d.fs.renameMu.Unlock()
 
+	d.unregisterWatches()
+
+	if d.fs.wb != nil {
+		d.fs.wb.remove(d)
+	}
+
 	mf := d.fs.mfp.MemoryFile()
 	d.handleMu.Lock()
 	d.dataMu.Lock()
@@ -2152,6 +2585,7 @@ func (d *dentry) destroyLocked(ctx context.Context) {
 		mf.MarkAllUnevictable(d)
 		d.cache.DropAll(mf)
 		d.dirty.RemoveAll()
+		d.updateCachedBytesLocked()
 	}
 	d.dataMu.Unlock()
 	if d.fs.opts.lisaEnabled {
@@ -2184,6 +2618,10 @@ func (d *dentry) destroyLocked(ctx context.Context) {
 	d.mmapFD = atomicbitops.FromInt32(-1)
 	d.handleMu.Unlock()
 
+	if d.isDir() {
+		negativeDentries.untrack(d)
+	}
+
 	if !d.isSynthetic() {
 		// Note that it's possible that d.atimeDirty or d.mtimeDirty are true,
 		// i.e. client and server timestamps may differ (because e.g. a client
@@ -2200,7 +2638,13 @@ func (d *dentry) destroyLocked(ctx context.Context) {
 			// destroyed is a deleted regular file. This is to release the disk space
 			// on remote immediately.
 			flushClose := d.isDeleted() && d.isRegularFile()
-			d.controlFDLisa.Close(ctx, flushClose)
+			d.forgetDelegation()
+			if d.controlFDLisa.Ok() {
+				d.controlFDLisa.Close(ctx, flushClose)
+			}
+			if d.directfs != nil {
+				d.destroyDirectfs()
+			}
 		} else {
 			if err := d.file.close(ctx); err != nil {
 				log.Warningf("gofer.dentry.destroyLocked: failed to close file: %v", err)
@@ -2234,12 +2678,15 @@ func (d *dentry) setDeleted() {
 
 func (d *dentry) isControlFileOk() bool {
 	if d.fs.opts.lisaEnabled {
-		return d.controlFDLisa.Ok()
+		return d.controlFDLisa.Ok() || d.directfs != nil
 	}
 	return !d.file.isNil()
 }
 
 func (d *dentry) isReadFileOk() bool {
+	if d.directfs != nil {
+		return d.readFD.Load() >= 0
+	}
 	if d.fs.opts.lisaEnabled {
 		return d.readFDLisa.Ok()
 	}
@@ -2247,7 +2694,7 @@ func (d *dentry) isReadFileOk() bool {
 }
 
 func (d *dentry) listXattr(ctx context.Context, size uint64) ([]string, error) {
-	if !d.isControlFileOk() {
+	if !d.isControlFileOk() || d.directfs != nil {
 		return nil, nil
 	}
 
@@ -2267,7 +2714,7 @@ func (d *dentry) listXattr(ctx context.Context, size uint64) ([]string, error) {
 }
 
 func (d *dentry) getXattr(ctx context.Context, creds *auth.Credentials, opts *vfs.GetXattrOptions) (string, error) {
-	if !d.isControlFileOk() {
+	if !d.isControlFileOk() || d.directfs != nil {
 		return "", linuxerr.ENODATA
 	}
 	if err := d.checkXattrPermissions(creds, opts.Name, vfs.MayRead); err != nil {
@@ -2286,6 +2733,12 @@ func (d *dentry) setXattr(ctx context.Context, creds *auth.Credentials, opts *vf
 	if err := d.checkXattrPermissions(creds, opts.Name, vfs.MayWrite); err != nil {
 		return err
 	}
+	if err := d.checkDirectfsWrite(); err != nil {
+		return err
+	}
+	if err := d.checkVerityWrite(); err != nil {
+		return err
+	}
 	if d.fs.opts.lisaEnabled {
 		return d.controlFDLisa.SetXattr(ctx, opts.Name, opts.Value, opts.Flags)
 	}
@@ -2299,6 +2752,12 @@ func (d *dentry) removeXattr(ctx context.Context, creds *auth.Credentials, name
 	if err := d.checkXattrPermissions(creds, name, vfs.MayWrite); err != nil {
 		return err
 	}
+	if err := d.checkDirectfsWrite(); err != nil {
+		return err
+	}
+	if err := d.checkVerityWrite(); err != nil {
+		return err
+	}
 	if d.fs.opts.lisaEnabled {
 		return d.controlFDLisa.RemoveXattr(ctx, name)
 	}
@@ -2309,6 +2768,10 @@ func (d *dentry) removeXattr(ctx context.Context, creds *auth.Credentials, name
 //   - !d.isSynthetic().
 //   - d.isRegularFile() || d.isDir().
 func (d *dentry) ensureSharedHandle(ctx context.Context, read, write, trunc bool) error {
+	if d.directfs != nil {
+		return d.ensureSharedHandleDirectfs(ctx, write, trunc)
+	}
+
 	// O_TRUNC unconditionally requires us to obtain a new handle (opened with
 	// O_TRUNC).
 	if !trunc {
@@ -2473,23 +2936,24 @@ func (d *dentry) ensureSharedHandle(ctx context.Context, read, write, trunc bool
 
 		// Switch to new fids/FDs.
 		if d.fs.opts.lisaEnabled {
-			oldReadFD := lisafs.InvalidFDID
+			var oldReadFD, oldWriteFD lisafs.ClientFD
 			if openReadable {
-				oldReadFD = d.readFDLisa.ID()
+				oldReadFD = d.readFDLisa
 				d.readFDLisa = h.fdLisa
 			}
-			oldWriteFD := lisafs.InvalidFDID
 			if openWritable {
-				oldWriteFD = d.writeFDLisa.ID()
+				oldWriteFD = d.writeFDLisa
 				d.writeFDLisa = h.fdLisa
 			}
 			// NOTE(b/141991141): Close old FDs before making new fids visible (by
-			// unlocking d.handleMu).
+			// unlocking d.handleMu). The old FDs may have been obtained on a
+			// previous connection, so close them through their ClientFDs.
+			sameFD := oldReadFD == oldWriteFD
 			if oldReadFD.Ok() {
-				d.fs.clientLisa.CloseFD(ctx, oldReadFD, false /* flush */)
+				oldReadFD.Close(ctx, false /* flush */)
 			}
-			if oldWriteFD.Ok() && oldReadFD != oldWriteFD {
-				d.fs.clientLisa.CloseFD(ctx, oldWriteFD, false /* flush */)
+			if oldWriteFD.Ok() && !sameFD {
+				oldWriteFD.Close(ctx, false /* flush */)
 			}
 		} else {
 			var oldReadFile p9file
@@ -2593,6 +3057,9 @@ func (d *dentry) syncCachedFile(ctx context.Context, forFilesystemSync bool) err
 		// Write back dirty pages to the remote file.
 		d.dataMu.Lock()
 		err := fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt)
+		if err == nil && d.fs.wb != nil && d.dirty.IsEmpty() {
+			d.fs.wb.forget(d)
+		}
 		d.dataMu.Unlock()
 		if err != nil {
 			return err
@@ -2654,7 +3121,7 @@ func (fd *fileDescription) dentry() *dentry {
 func (fd *fileDescription) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
 	d := fd.dentry()
 	const validMask = uint32(linux.STATX_MODE | linux.STATX_UID | linux.STATX_GID | linux.STATX_ATIME | linux.STATX_MTIME | linux.STATX_CTIME | linux.STATX_SIZE | linux.STATX_BLOCKS | linux.STATX_BTIME)
-	if !d.cachedMetadataAuthoritative() && opts.Mask&validMask != 0 && opts.Sync != linux.AT_STATX_DONT_SYNC {
+	if !d.cachedMetadataAuthoritative() && opts.Mask&validMask != 0 && opts.Sync != linux.AT_STATX_DONT_SYNC && !d.fs.metadataDelegated(d) {
 		if d.fs.opts.lisaEnabled {
 			// Use specialFileFD.handle.fileLisa for the Stat if available, for the
 			// same reason that we try to use open FD in updateFromStatLisaLocked().
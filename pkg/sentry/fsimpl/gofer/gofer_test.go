@@ -17,8 +17,11 @@ package gofer
 import (
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/p9"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 )
@@ -65,3 +68,77 @@ func TestDestroyIdempotent(t *testing.T) {
 	child.checkCachingLocked(ctx, true /* renameMuWriteLocked */)
 	child.checkCachingLocked(ctx, true /* renameMuWriteLocked */)
 }
+
+func TestIDMappings(t *testing.T) {
+	ctx := contexttest.Context(t)
+	fs := filesystem{
+		mfp:          pgalloc.MemoryFileProviderFromContext(ctx),
+		inoByQIDPath: make(map[uint64]uint64),
+		inoByKey:     make(map[inoKey]uint64),
+		clock:        time.RealtimeClockFromContext(ctx),
+		dentryCache:  &dentryCache{maxCachedDentries: 0},
+		iopts: InternalFilesystemOptions{
+			UIDMappings: []auth.IDMapEntry{{FirstID: 0, FirstParentID: 100000, Length: 1000}},
+			GIDMappings: []auth.IDMapEntry{{FirstID: 0, FirstParentID: 200000, Length: 1000}},
+		},
+	}
+
+	attr := &p9.Attr{
+		Mode: p9.ModeRegular,
+		UID:  100010,
+		GID:  300000,
+	}
+	mask := p9.AttrMask{
+		Mode: true,
+		UID:  true,
+		GID:  true,
+	}
+	d, err := fs.newDentry(ctx, p9file{}, p9.QID{}, mask, attr)
+	if err != nil {
+		t.Fatalf("fs.newDentry(): %v", err)
+	}
+	if got, want := d.uid.Load(), uint32(10); got != want {
+		t.Errorf("d.uid = %d, want %d", got, want)
+	}
+	// The group isn't mapped.
+	if got, want := d.gid.Load(), uint32(auth.OverflowGID); got != want {
+		t.Errorf("d.gid = %d, want %d", got, want)
+	}
+
+	uid, gid, err := fs.remoteOwner(10, 20)
+	if err != nil {
+		t.Fatalf("fs.remoteOwner(10, 20): %v", err)
+	}
+	if uid != 100010 || gid != 200020 {
+		t.Errorf("fs.remoteOwner(10, 20) = %d, %d, want 100010, 200020", uid, gid)
+	}
+	if _, _, err := fs.remoteOwner(1000, 0); !linuxerr.Equals(linuxerr.EOVERFLOW, err) {
+		t.Errorf("fs.remoteOwner(1000, 0) = %v, want EOVERFLOW", err)
+	}
+	if _, err := fs.remoteGID(auth.NoID); !linuxerr.Equals(linuxerr.EOVERFLOW, err) {
+		t.Errorf("fs.remoteGID(NoID) = %v, want EOVERFLOW", err)
+	}
+}
+
+func TestChargeReadahead(t *testing.T) {
+	fs := filesystem{
+		opts: filesystemOptions{readaheadBytes: 3*hostarch.PageSize + 100},
+	}
+	if got, want := fs.chargeReadahead(2*hostarch.PageSize), uint64(2*hostarch.PageSize); got != want {
+		t.Errorf("fs.chargeReadahead(2 pages) = %d, want %d", got, want)
+	}
+	// Only one more whole page fits within the limit.
+	if got, want := fs.chargeReadahead(2*hostarch.PageSize), uint64(hostarch.PageSize); got != want {
+		t.Errorf("fs.chargeReadahead(2 pages) = %d, want %d", got, want)
+	}
+	if got := fs.chargeReadahead(hostarch.PageSize); got != 0 {
+		t.Errorf("fs.chargeReadahead(1 page) over the limit = %d, want 0", got)
+	}
+	fs.unchargeReadahead(3 * hostarch.PageSize)
+	if got := fs.readaheadBytes.Load(); got != 0 {
+		t.Errorf("fs.readaheadBytes = %d after uncharging everything, want 0", got)
+	}
+	if got := readaheadBytes.Load(); got != 0 {
+		t.Errorf("readaheadBytes = %d after uncharging everything, want 0", got)
+	}
+}
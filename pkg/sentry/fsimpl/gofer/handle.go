@@ -103,7 +103,11 @@ func (h *handle) isOpen() bool {
 	if h.fdLisa.Client() != nil {
 		return h.fdLisa.Ok()
 	}
-	return !h.file.isNil()
+	if h.file.isNil() {
+		// Handles of files accessed with directfs only have a host FD.
+		return h.fd >= 0
+	}
+	return true
 }
 
 func (h *handle) close(ctx context.Context) {
@@ -0,0 +1,113 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// An idmapped mount presents files owned by IDs on the remote filesystem as
+// owned by other IDs, as specified by the mount's UID and GID mappings. In
+// each auth.IDMapEntry, the range starting at FirstParentID on the remote
+// filesystem is presented as the range starting at FirstID. dentry.uid and
+// dentry.gid hold presented IDs; IDs are translated when they are received
+// from or sent to the server.
+
+// mapIDToMount returns the ID presented for id on the remote filesystem, and
+// true, or false if id is not mapped.
+func mapIDToMount(entries []auth.IDMapEntry, id uint32) (uint32, bool) {
+	for _, e := range entries {
+		if id >= e.FirstParentID && id-e.FirstParentID < e.Length {
+			return e.FirstID + (id - e.FirstParentID), true
+		}
+	}
+	return 0, false
+}
+
+// mapIDFromMount returns the ID on the remote filesystem that is presented as
+// id, and true, or false if id is not mapped.
+func mapIDFromMount(entries []auth.IDMapEntry, id uint32) (uint32, bool) {
+	for _, e := range entries {
+		if id >= e.FirstID && id-e.FirstID < e.Length {
+			return e.FirstParentID + (id - e.FirstID), true
+		}
+	}
+	return 0, false
+}
+
+// mountUID returns the UID presented for the file owner uid on the remote
+// filesystem.
+func (fs *filesystem) mountUID(uid uint32) uint32 {
+	if len(fs.iopts.UIDMappings) == 0 {
+		return uid
+	}
+	if id, ok := mapIDToMount(fs.iopts.UIDMappings, uid); ok {
+		return id
+	}
+	return uint32(auth.OverflowUID)
+}
+
+// mountGID returns the GID presented for the file group gid on the remote
+// filesystem.
+func (fs *filesystem) mountGID(gid uint32) uint32 {
+	if len(fs.iopts.GIDMappings) == 0 {
+		return gid
+	}
+	if id, ok := mapIDToMount(fs.iopts.GIDMappings, gid); ok {
+		return id
+	}
+	return uint32(auth.OverflowGID)
+}
+
+// remoteUID returns the owner on the remote filesystem of a file presented as
+// owned by kuid. As in Linux, it returns EOVERFLOW if kuid is not mapped.
+func (fs *filesystem) remoteUID(kuid auth.KUID) (auth.KUID, error) {
+	if len(fs.iopts.UIDMappings) == 0 {
+		return kuid, nil
+	}
+	uid, ok := mapIDFromMount(fs.iopts.UIDMappings, uint32(kuid))
+	if !ok {
+		return 0, linuxerr.EOVERFLOW
+	}
+	return auth.KUID(uid), nil
+}
+
+// remoteGID returns the group on the remote filesystem of a file presented as
+// owned by kgid. As in Linux, it returns EOVERFLOW if kgid is not mapped.
+func (fs *filesystem) remoteGID(kgid auth.KGID) (auth.KGID, error) {
+	if len(fs.iopts.GIDMappings) == 0 {
+		return kgid, nil
+	}
+	gid, ok := mapIDFromMount(fs.iopts.GIDMappings, uint32(kgid))
+	if !ok {
+		return 0, linuxerr.EOVERFLOW
+	}
+	return auth.KGID(gid), nil
+}
+
+// remoteOwner returns the owner and group on the remote filesystem of a new
+// file presented as owned by kuid and kgid.
+func (fs *filesystem) remoteOwner(kuid auth.KUID, kgid auth.KGID) (auth.KUID, auth.KGID, error) {
+	uid, err := fs.remoteUID(kuid)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := fs.remoteGID(kgid)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
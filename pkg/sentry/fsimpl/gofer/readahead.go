@@ -0,0 +1,341 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"math"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Readahead parameters. A sequential reader's first readahead covers
+// minReadaheadWindow bytes; each subsequent readahead covers twice as many,
+// up to maxReadaheadWindow. Readahead is performed in readaheadChunk-sized
+// pieces so that readers aren't locked out of the page cache for long.
+// defaultReadaheadBytes is the default value of
+// filesystemOptions.readaheadBytes.
+const (
+	minReadaheadWindow    = 128 << 10
+	maxReadaheadWindow    = 4 << 20
+	readaheadChunk        = 512 << 10
+	defaultReadaheadBytes = 32 << 20
+)
+
+var (
+	// readaheadBytes is the sum of filesystem.readaheadBytes over all gofer
+	// filesystems.
+	readaheadBytes atomicbitops.Uint64
+
+	readaheadIssued = metric.MustCreateNewUint64Metric("/fs/cache/readahead_issued_bytes", false /* sync */, "Bytes of gofer file data read ahead of sequential readers.")
+	readaheadUnused = metric.MustCreateNewUint64Metric("/fs/cache/readahead_unused_bytes", false /* sync */, "Bytes of gofer file data read ahead of a reader that it didn't read before its access pattern changed or it was closed.")
+)
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/fs/cache/readahead_bytes", false /* cumulative */, false /* sync */, "Bytes of gofer file data read ahead of sequential readers and not yet read. These are included in /fs/cache/bytes for file_pages.", func(...string) uint64 {
+		return readaheadBytes.Load()
+	})
+}
+
+// readahead is the readahead state of a regularFileFD.
+//
+// Reads through a regularFileFD are sequential if each starts where the
+// previous one ended. Once they are, the data following the reader's position
+// is read into the page cache in the background, up to window bytes ahead of
+// it. Another readahead starts once the reader has consumed half of the data
+// read ahead, with twice the window. A non-sequential read stops readahead
+// until reads are sequential again. Data read ahead but not yet read is
+// charged to the filesystem's readahead limit
+// (filesystemOptions.readaheadBytes).
+//
+// Readahead only applies to reads through the page cache. For files read
+// directly from a host FD, the host is asked to read ahead instead. Files
+// opened with O_DIRECT are never read ahead.
+type readahead struct {
+	// mu protects the following fields.
+	mu sync.Mutex
+
+	// advice is the last of POSIX_FADV_NORMAL, POSIX_FADV_RANDOM and
+	// POSIX_FADV_SEQUENTIAL given for the file description.
+	advice int32
+
+	// next is the offset at which the next sequential read starts.
+	next uint64
+
+	// window is the size of the next readahead, or 0 if reads are not
+	// sequential.
+	window uint64
+
+	// end is the page-aligned end of the data read ahead.
+	end uint64
+
+	// charged is the number of bytes charged to filesystem.readaheadBytes.
+	charged uint64
+
+	// inflight is 1 while a readahead started for the file description is
+	// running.
+	inflight atomicbitops.Uint32
+}
+
+// chargeReadahead charges up to n bytes to fs' readahead limit and returns
+// the number of bytes charged, a multiple of the page size.
+func (fs *filesystem) chargeReadahead(n uint64) uint64 {
+	for {
+		cur := fs.readaheadBytes.Load()
+		if cur >= fs.opts.readaheadBytes {
+			return 0
+		}
+		if avail := hostarch.PageRoundDown(fs.opts.readaheadBytes - cur); n > avail {
+			n = avail
+		}
+		if n == 0 {
+			return 0
+		}
+		if fs.readaheadBytes.CompareAndSwap(cur, cur+n) {
+			readaheadBytes.Add(n)
+			return n
+		}
+	}
+}
+
+// unchargeReadahead undoes a previous call to chargeReadahead that returned
+// n.
+func (fs *filesystem) unchargeReadahead(n uint64) {
+	fs.readaheadBytes.Add(-n)
+	readaheadBytes.Add(-n)
+}
+
+// noteRead updates fd's readahead state after length bytes were read at
+// offset through the page cache, and starts reading ahead if appropriate.
+//
+// Preconditions: length > 0.
+func (fd *regularFileFD) noteRead(offset, length uint64) {
+	d := fd.dentry()
+	if d.fs.opts.readaheadBytes == 0 {
+		return
+	}
+	ra := &fd.ra
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	if ra.advice == linux.POSIX_FADV_RANDOM {
+		return
+	}
+	if offset != ra.next {
+		fd.resetReadaheadLocked()
+		ra.next = offset + length
+		if ra.advice != linux.POSIX_FADV_SEQUENTIAL {
+			// Wait for another sequential read.
+			return
+		}
+	}
+	ra.next = offset + length
+
+	// Release the charge for data that has now been read.
+	if pageNext := hostarch.PageRoundDown(ra.next); ra.end < pageNext {
+		ra.end = pageNext
+	}
+	var ahead uint64
+	if ra.end > ra.next {
+		ahead = ra.end - ra.next
+	}
+	if ra.charged > ahead {
+		d.fs.unchargeReadahead(ra.charged - ahead)
+		ra.charged = ahead
+	}
+
+	if ra.window == 0 {
+		ra.window = minReadaheadWindow
+		if ra.advice == linux.POSIX_FADV_SEQUENTIAL {
+			ra.window = maxReadaheadWindow
+		}
+	}
+	if ahead > ra.window/2 || ra.inflight.Load() != 0 {
+		return
+	}
+	end, ok := hostarch.PageRoundUp(ra.next + ra.window)
+	if !ok {
+		return
+	}
+	if d.cachedMetadataAuthoritative() {
+		if eof, ok := hostarch.PageRoundUp(d.size.Load()); ok && end > eof {
+			end = eof
+		}
+	}
+	if end <= ra.end {
+		return
+	}
+	n := d.fs.chargeReadahead(end - ra.end)
+	if n == 0 {
+		return
+	}
+	mr := memmap.MappableRange{ra.end, ra.end + n}
+	ra.end = mr.End
+	ra.charged += n
+	if ra.window < maxReadaheadWindow {
+		ra.window *= 2
+	}
+	readaheadIssued.IncrementBy(n)
+	ra.inflight.Store(1)
+	fd.startReadahead(mr, func() { ra.inflight.Store(0) })
+}
+
+// startReadahead calls fd.dentry().readahead(mr) in the background, followed
+// by done if it is not nil.
+func (fd *regularFileFD) startReadahead(mr memmap.MappableRange, done func()) {
+	d := fd.dentry()
+	// Hold a reference on fd so that the filesystem outlives the readahead.
+	fd.vfsfd.IncRef()
+	d.fs.readaheads.Add(1)
+	go func() { // S/R-SAFE: filesystem.PrepareSave waits for readahead.
+		defer d.fs.readaheads.Done()
+		ctx := context.Background()
+		d.readahead(ctx, mr)
+		if done != nil {
+			done()
+		}
+		fd.vfsfd.DecRef(ctx)
+	}()
+}
+
+// resetReadaheadLocked stops reading ahead for fd until reads are sequential
+// again.
+//
+// Preconditions: fd.ra.mu must be locked.
+func (fd *regularFileFD) resetReadaheadLocked() {
+	ra := &fd.ra
+	if ra.charged != 0 {
+		readaheadUnused.IncrementBy(ra.charged)
+		fd.dentry().fs.unchargeReadahead(ra.charged)
+		ra.charged = 0
+	}
+	ra.window = 0
+	ra.end = 0
+}
+
+// readahead reads the data in mr into d's page cache, or if d is read
+// directly from a host FD, asks the host to do so. Errors are ignored, since
+// they will be encountered again by the reader.
+func (d *dentry) readahead(ctx context.Context, mr memmap.MappableRange) {
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	h := d.readHandleLocked()
+	if !h.isOpen() {
+		return
+	}
+	if (d.mmapFD.RacyLoad() >= 0 && !d.fs.opts.forcePageCache) || d.fs.opts.interop == InteropModeShared {
+		if h.fd >= 0 {
+			if err := unix.Fadvise(int(h.fd), int64(mr.Start), int64(mr.Length()), unix.FADV_WILLNEED); err != nil {
+				log.Debugf("gofer.dentry.readahead: fadvise(POSIX_FADV_WILLNEED) failed: %v", err)
+			}
+		}
+		return
+	}
+	mf := d.fs.mfp.MemoryFile()
+	if !mf.ShouldCacheEvictable() {
+		return
+	}
+	for start := mr.Start; start < mr.End; {
+		chunk := memmap.MappableRange{start, mr.End}
+		if chunk.Length() > readaheadChunk {
+			chunk.End = start + readaheadChunk
+		}
+		d.dataMu.Lock()
+		size := d.size.Load()
+		if eof, ok := hostarch.PageRoundUp(size); ok && chunk.End > eof {
+			chunk.End = eof
+		}
+		if chunk.Start >= chunk.End {
+			d.dataMu.Unlock()
+			return
+		}
+		_, err := d.cache.Fill(ctx, chunk, chunk, size, mf, usage.PageCache, true /* populate */, d.readFunc(h))
+		mf.MarkEvictable(d, pgalloc.EvictableRange{chunk.Start, chunk.End})
+		d.updateCachedBytesLocked()
+		d.dataMu.Unlock()
+		if err != nil {
+			return
+		}
+		start = chunk.End
+	}
+}
+
+// Fadvise implements vfs.FileDescriptionImplFadviseExtension.Fadvise.
+func (fd *regularFileFD) Fadvise(ctx context.Context, offset, length int64, advice int32) error {
+	d := fd.dentry()
+	switch advice {
+	case linux.POSIX_FADV_NORMAL, linux.POSIX_FADV_RANDOM, linux.POSIX_FADV_SEQUENTIAL:
+		// As in Linux, these apply to the whole file description, ignoring
+		// offset and length.
+		fd.ra.mu.Lock()
+		fd.ra.advice = advice
+		fd.resetReadaheadLocked()
+		fd.ra.mu.Unlock()
+
+	case linux.POSIX_FADV_WILLNEED:
+		if offset < 0 || fd.vfsfd.StatusFlags()&linux.O_DIRECT != 0 || d.fs.opts.readaheadBytes == 0 {
+			return nil
+		}
+		// Data read ahead for POSIX_FADV_WILLNEED isn't charged to the
+		// filesystem's readahead limit, since it isn't consumed by a
+		// sequential reader, but each call reads ahead at most that much.
+		start := hostarch.PageRoundDown(uint64(offset))
+		length := uint64(length)
+		if length == 0 || length > d.fs.opts.readaheadBytes {
+			length = d.fs.opts.readaheadBytes
+		}
+		end, ok := hostarch.PageRoundUp(uint64(offset) + length)
+		if !ok {
+			end = hostarch.PageRoundDown(math.MaxUint64)
+		}
+		if start < end {
+			fd.startReadahead(memmap.MappableRange{start, end}, nil)
+		}
+
+	case linux.POSIX_FADV_DONTNEED:
+		if offset < 0 {
+			return nil
+		}
+		d.handleMu.RLock()
+		if hostFD := d.readFD.RacyLoad(); hostFD >= 0 {
+			if err := unix.Fadvise(int(hostFD), offset, length, unix.FADV_DONTNEED); err != nil {
+				log.Debugf("gofer.regularFileFD.Fadvise: fadvise(POSIX_FADV_DONTNEED) failed: %v", err)
+			}
+		}
+		d.handleMu.RUnlock()
+		// As in Linux, only whole pages are dropped. Dirty pages are
+		// written back first, and memory-mapped pages are not dropped.
+		start, ok := hostarch.PageRoundUp(uint64(offset))
+		if !ok {
+			return nil
+		}
+		end := uint64(math.MaxUint64)
+		if length != 0 && uint64(offset)+uint64(length) > uint64(offset) {
+			end = hostarch.PageRoundDown(uint64(offset) + uint64(length))
+		}
+		if start < end {
+			d.Evict(ctx, pgalloc.EvictableRange{start, end})
+		}
+	}
+	return nil
+}
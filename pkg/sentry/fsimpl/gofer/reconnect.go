@@ -0,0 +1,170 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/unet"
+)
+
+// reconnectMu protects reconnectable.
+var reconnectMu sync.Mutex
+
+// reconnectable maps container IDs to the filesystems of that container that
+// can reconnect to their server. It is protected by reconnectMu.
+var reconnectable = make(map[string]map[*filesystem]struct{})
+
+// registerReconnectable makes fs available to Reconnect, if enabled.
+func (fs *filesystem) registerReconnectable() {
+	if !fs.opts.lisaEnabled || fs.iopts.ReconnectTimeout == 0 {
+		return
+	}
+	reconnectMu.Lock()
+	defer reconnectMu.Unlock()
+	fss, ok := reconnectable[fs.iopts.ContainerID]
+	if !ok {
+		fss = make(map[*filesystem]struct{})
+		reconnectable[fs.iopts.ContainerID] = fss
+	}
+	fss[fs] = struct{}{}
+}
+
+// unregisterReconnectable undoes registerReconnectable.
+func (fs *filesystem) unregisterReconnectable() {
+	reconnectMu.Lock()
+	defer reconnectMu.Unlock()
+	fss, ok := reconnectable[fs.iopts.ContainerID]
+	if !ok {
+		return
+	}
+	delete(fss, fs)
+	if len(fss) == 0 {
+		delete(reconnectable, fs.iopts.ContainerID)
+	}
+}
+
+// onDisconnect is called when fs loses its connection to the server.
+func (fs *filesystem) onDisconnect() {
+	log.Warningf("gofer: filesystem %q of container %q lost its connection to the gofer, waiting up to %v for it to be recovered", fs.iopts.UniqueID, fs.iopts.ContainerID, fs.iopts.ReconnectTimeout)
+}
+
+// Reconnect reconnects the filesystems of container containerID that lost
+// their connection to the server. fds maps filesystem unique IDs (cf.
+// InternalFilesystemOptions.UniqueID) to host FDs connected to the new
+// server. Reconnect removes the FDs it takes ownership of from fds; the caller
+// is responsible for closing the remaining ones.
+func Reconnect(ctx context.Context, containerID string, fds map[string]int) error {
+	reconnectMu.Lock()
+	var fss []*filesystem
+	for fs := range reconnectable[containerID] {
+		if _, ok := fds[fs.iopts.UniqueID]; ok {
+			fss = append(fss, fs)
+		}
+	}
+	reconnectMu.Unlock()
+
+	var retErr error
+	for _, fs := range fss {
+		fd := fds[fs.iopts.UniqueID]
+		delete(fds, fs.iopts.UniqueID)
+		if err := fs.reconnect(ctx, fd); err != nil && retErr == nil {
+			retErr = fmt.Errorf("reconnecting filesystem %q: %w", fs.iopts.UniqueID, err)
+		}
+	}
+	return retErr
+}
+
+// reconnect reconnects fs to the server over the host socket fd, which it
+// takes ownership of.
+func (fs *filesystem) reconnect(ctx context.Context, fd int) error {
+	sock, err := unet.NewSocket(fd)
+	if err != nil {
+		return err
+	}
+	ctx.UninterruptibleSleepStart(false)
+	err = fs.clientLisa.Reconnect(sock)
+	ctx.UninterruptibleSleepFinish(false)
+	if err != nil {
+		return err
+	}
+	// Delegations were all recalled when the connection was lost.
+	fs.initDelegations()
+	fs.revalidateAfterReconnect(ctx)
+	return nil
+}
+
+// revalidateAfterReconnect looks up the files of all dentries in the tree on
+// the current connection, and invalidates the dentries whose files no longer
+// exist or have been replaced by different files while fs was disconnected.
+func (fs *filesystem) revalidateAfterReconnect(ctx context.Context) {
+	var ds *[]*dentry
+	fs.renameMu.RLock()
+	defer fs.renameMuRUnlockAndCheckCaching(ctx, &ds)
+
+	invalidated := 0
+	dirs := []*dentry{fs.root}
+	for len(dirs) > 0 {
+		parent := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+
+		var (
+			names    []string
+			children []*dentry
+		)
+		parent.dirMu.Lock()
+		for name, child := range parent.children {
+			if child != nil && !child.isSynthetic() && child.directfs == nil {
+				names = append(names, name)
+				children = append(children, child)
+			}
+		}
+		parent.dirMu.Unlock()
+
+		for i, child := range children {
+			child.metadataMu.Lock()
+			err := child.updateFromStatLisaLocked(ctx, &child.controlFDLisa)
+			child.metadataMu.Unlock()
+			if err == nil {
+				if child.isDir() {
+					dirs = append(dirs, child)
+				}
+				continue
+			}
+			if !linuxerr.Equals(linuxerr.ESTALE, err) {
+				ctx.Debugf("gofer.filesystem.revalidateAfterReconnect: stat failed: %v", err)
+				continue
+			}
+
+			// See filesystem.revalidateHelper.
+			child.IncRef()
+			fs.vfsfs.VirtualFilesystem().InvalidateDentry(ctx, &child.vfsd)
+			child.decRefNoCaching()
+			ds = appendDentry(ds, child)
+			parent.dirMu.Lock()
+			if parent.children[names[i]] == child {
+				delete(parent.children, names[i])
+				parent.clearDirentsLocked()
+			}
+			parent.dirMu.Unlock()
+			invalidated++
+		}
+	}
+	log.Infof("gofer: filesystem %q of container %q reconnected, %d cached dentries invalidated", fs.iopts.UniqueID, fs.iopts.ContainerID, invalidated)
+}
@@ -19,6 +19,7 @@ import (
 	"io"
 	"math"
 
+	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -48,6 +49,9 @@ type regularFileFD struct {
 	// off is the file offset. off is protected by mu.
 	mu  sync.Mutex `state:"nosave"`
 	off int64
+
+	// ra is the readahead state of the file description. See readahead.go.
+	ra readahead `state:"nosave"`
 }
 
 func newRegularFileFD(mnt *vfs.Mount, d *dentry, flags uint32) (*regularFileFD, error) {
@@ -71,6 +75,9 @@ func newRegularFileFD(mnt *vfs.Mount, d *dentry, flags uint32) (*regularFileFD,
 
 // Release implements vfs.FileDescriptionImpl.Release.
 func (fd *regularFileFD) Release(context.Context) {
+	fd.ra.mu.Lock()
+	fd.resetReadaheadLocked()
+	fd.ra.mu.Unlock()
 }
 
 // OnClose implements vfs.FileDescriptionImpl.OnClose.
@@ -79,6 +86,13 @@ func (fd *regularFileFD) OnClose(ctx context.Context) error {
 		return nil
 	}
 	d := fd.dentry()
+	if d.fs.opts.writeback {
+		// Write back data written through fd, so that the remote file is up
+		// to date once the last writer has closed it.
+		if err := d.writeback(ctx, 0, math.MaxInt64); err != nil {
+			return err
+		}
+	}
 	if d.fs.opts.interop == InteropModeExclusive {
 		// d may have dirty pages that we won't write back now (and wouldn't
 		// have in VFS1), making a flushf RPC ineffective. If this is the case,
@@ -112,9 +126,7 @@ func (fd *regularFileFD) OnClose(ctx context.Context) error {
 // Allocate implements vfs.FileDescriptionImpl.Allocate.
 func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
 	d := fd.dentry()
-	return d.doAllocate(ctx, offset, length, func() error {
-		d.handleMu.RLock()
-		defer d.handleMu.RUnlock()
+	return d.doAllocate(ctx, mode, offset, length, func() error {
 		if d.fs.opts.lisaEnabled {
 			return d.writeFDLisa.Allocate(ctx, mode, offset, length)
 		}
@@ -143,9 +155,10 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 	// Check that flags are supported.
 	//
 	// TODO(gvisor.dev/issue/2601): Support select preadv2 flags.
-	if opts.Flags&^linux.RWF_HIPRI != 0 {
+	if opts.Flags&^(linux.RWF_HIPRI|linux.RWF_NOWAIT) != 0 {
 		return 0, linuxerr.EOPNOTSUPP
 	}
+	nowait := opts.Flags&linux.RWF_NOWAIT != 0
 
 	// Check for reading at EOF before calling into MM (but not under
 	// InteropModeShared, which makes d.size unreliable).
@@ -153,6 +166,10 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		return 0, io.EOF
 	}
 
+	if !nowait {
+		usage.ThrottleIO(ctx, false /* write */, dst.NumBytes())
+	}
+
 	var (
 		n       int64
 		readErr error
@@ -170,6 +187,7 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		rw := getDentryReadWriter(ctx, d, offset)
 		// Require the read to go to the remote file.
 		rw.direct = true
+		rw.nowait = nowait
 		n, readErr = dst.CopyOutFrom(ctx, rw)
 		putDentryReadWriter(rw)
 		if d.fs.opts.interop != InteropModeShared {
@@ -178,16 +196,26 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		}
 	} else {
 		rw := getDentryReadWriter(ctx, d, offset)
+		rw.nowait = nowait
 		n, readErr = dst.CopyOutFrom(ctx, rw)
 		putDentryReadWriter(rw)
+		if n > 0 {
+			fd.noteRead(uint64(offset), uint64(n))
+		}
 		if d.fs.opts.interop != InteropModeShared {
 			// Compare Linux's mm/filemap.c:do_generic_file_read() => file_accessed().
 			d.touchAtime(fd.vfsfd.Mount())
 		}
 	}
+	usage.AccountIO(ctx, usage.IOSourceGofer, false /* write */, n)
 	return n, readErr
 }
 
+// CacheStat implements vfs.FileDescriptionImplCacheStatExtension.CacheStat.
+func (fd *regularFileFD) CacheStat(ctx context.Context, mr memmap.MappableRange) (memmap.CacheStat, error) {
+	return fd.dentry().CacheStat(mr), nil
+}
+
 // Read implements vfs.FileDescriptionImpl.Read.
 func (fd *regularFileFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
 	fd.mu.Lock()
@@ -217,6 +245,8 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 		return 0, offset, linuxerr.EOPNOTSUPP
 	}
 
+	usage.ThrottleIO(ctx, true /* write */, src.NumBytes())
+
 	d := fd.dentry()
 
 	d.metadataMu.Lock()
@@ -252,8 +282,12 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 	rw := getDentryReadWriter(ctx, d, offset)
 	defer putDentryReadWriter(rw)
 
+	// Under write-back caching, writes fill the cache unless they must reach
+	// the remote file synchronously anyway.
+	rw.fillCache = d.fs.opts.writeback && fd.vfsfd.StatusFlags()&(linux.O_DIRECT|linux.O_DSYNC|linux.O_SYNC) == 0
+
 	if fd.vfsfd.StatusFlags()&linux.O_DIRECT != 0 {
-		if err := fd.writeCache(ctx, d, offset, src); err != nil {
+		if err := fd.writeCache(ctx, d, offset, src.NumBytes()); err != nil {
 			return 0, offset, err
 		}
 
@@ -262,6 +296,7 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 	}
 
 	n, err := src.CopyInTo(ctx, rw)
+	usage.AccountIO(ctx, usage.IOSourceGofer, true /* write */, n)
 	if err != nil {
 		return n, offset + n, err
 	}
@@ -285,41 +320,128 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 	// As with Linux, writing clears the setuid and setgid bits.
 	if n > 0 {
-		oldMode := d.mode.Load()
-		// If setuid or setgid were set, update d.mode and propagate
-		// changes to the host.
-		if newMode := vfs.ClearSUIDAndSGID(oldMode); newMode != oldMode {
-			d.mode.Store(newMode)
-			if d.fs.opts.lisaEnabled {
-				stat := linux.Statx{Mask: linux.STATX_MODE, Mode: uint16(newMode)}
-				failureMask, failureErr, err := d.controlFDLisa.SetStat(ctx, &stat)
-				if err != nil {
-					return 0, offset, err
-				}
-				if failureMask != 0 {
-					return 0, offset, failureErr
-				}
-			} else {
-				if err := d.file.setAttr(ctx, p9.SetAttrMask{Permissions: true}, p9.SetAttr{Permissions: p9.FileMode(newMode)}); err != nil {
-					return 0, offset, err
-				}
-			}
+		if err := d.clearSUIDAndSGIDLocked(ctx); err != nil {
+			return 0, offset, err
 		}
 	}
 
 	return n, offset + n, nil
 }
 
-func (fd *regularFileFD) writeCache(ctx context.Context, d *dentry, offset int64, src usermem.IOSequence) error {
+// clearSUIDAndSGIDLocked clears the setuid and setgid bits of d's mode, if
+// they are set, and propagates the change to the remote file.
+//
+// Preconditions: d.metadataMu must be locked.
+func (d *dentry) clearSUIDAndSGIDLocked(ctx context.Context) error {
+	oldMode := d.mode.Load()
+	newMode := vfs.ClearSUIDAndSGID(oldMode)
+	if newMode == oldMode {
+		return nil
+	}
+	d.mode.Store(newMode)
+	if d.fs.opts.lisaEnabled {
+		stat := linux.Statx{Mask: linux.STATX_MODE, Mode: uint16(newMode)}
+		failureMask, failureErr, err := d.controlFDLisa.SetStat(ctx, &stat)
+		if err != nil {
+			return err
+		}
+		if failureMask != 0 {
+			return failureErr
+		}
+		return nil
+	}
+	return d.file.setAttr(ctx, p9.SetAttrMask{Permissions: true}, p9.SetAttr{Permissions: p9.FileMode(newMode)})
+}
+
+// CopyFileRangeFrom copies up to count bytes from src, starting at srcOff, to
+// fd at offset off, without copying the data through the sentry. It returns
+// EXDEV if the copy can't be offloaded to the gofer, in which case the caller
+// should fall back to copying the data itself.
+//
+// CopyFileRangeFrom is used by copy_file_range(2).
+func (fd *regularFileFD) CopyFileRangeFrom(ctx context.Context, src *vfs.FileDescription, srcOff, off, count int64) (int64, error) {
+	srcFD, ok := src.Impl().(*regularFileFD)
+	if !ok {
+		return 0, linuxerr.EXDEV
+	}
+	d := fd.dentry()
+	srcD := srcFD.dentry()
+	// Server-side copies are only possible between files on the same gofer
+	// connection. Data read from verity mounts must be verified by the
+	// sentry.
+	if !d.fs.opts.lisaEnabled || srcD.fs.clientLisa != d.fs.clientLisa || srcD.verity != nil {
+		return 0, linuxerr.EXDEV
+	}
+
+	// Write dirty cached pages in the source range back to the remote file,
+	// so that the gofer copies up-to-date data.
+	if err := srcD.writeback(ctx, srcOff, count); err != nil {
+		return 0, err
+	}
+
+	d.metadataMu.Lock()
+	defer d.metadataMu.Unlock()
+	limit, err := vfs.CheckLimit(ctx, off, count)
+	if err != nil {
+		return 0, err
+	}
+	// Cached pages in the destination range are stale after the copy.
+	if err := fd.writeCache(ctx, d, off, limit); err != nil {
+		return 0, err
+	}
+
+	if srcD != d {
+		rlockTwoHandles(srcD, d)
+	} else {
+		d.handleMu.RLock()
+	}
+	srcH := srcD.readHandleLocked()
+	h := d.writeHandleLocked()
+	if !srcH.fdLisa.Ok() || !h.fdLisa.Ok() {
+		err = linuxerr.EXDEV
+	}
+	var n uint64
+	if err == nil {
+		n, err = h.fdLisa.CopyFileRange(ctx, srcH.fdLisa, uint64(srcOff), uint64(off), uint64(limit))
+	}
+	if srcD != d {
+		srcD.handleMu.RUnlock()
+	}
+	d.handleMu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	d.dataMu.Lock()
+	if end := uint64(off) + n; end > d.size.Load() {
+		d.size.Store(end)
+	}
+	d.dataMu.Unlock()
+	if d.fs.opts.interop != InteropModeShared {
+		d.touchCMtimeLocked()
+	}
+	if srcD != d {
+		srcD.touchAtime(srcFD.vfsfd.Mount())
+	}
+	if err := d.clearSUIDAndSGIDLocked(ctx); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+func (fd *regularFileFD) writeCache(ctx context.Context, d *dentry, offset, size int64) error {
 	// Write dirty cached pages that will be touched by the write back to
 	// the remote file.
-	if err := d.writeback(ctx, offset, src.NumBytes()); err != nil {
+	if err := d.writeback(ctx, offset, size); err != nil {
 		return err
 	}
 
 	// Remove touched pages from the cache.
 	pgstart := hostarch.PageRoundDown(uint64(offset))
-	pgend, ok := hostarch.PageRoundUp(uint64(offset + src.NumBytes()))
+	pgend, ok := hostarch.PageRoundUp(uint64(offset + size))
 	if !ok {
 		return linuxerr.EINVAL
 	}
@@ -362,6 +484,15 @@ type dentryReadWriter struct {
 	d      *dentry
 	off    uint64
 	direct bool
+
+	// If fillCache is true, writes to offsets that aren't cached allocate
+	// cached pages rather than writing to the remote file.
+	fillCache bool
+
+	// If nowait is true, reads of offsets that aren't cached fail with
+	// ErrWouldBlock rather than reading from the remote file, as for
+	// preadv2(RWF_NOWAIT).
+	nowait bool
 }
 
 var dentryReadWriterPool = sync.Pool{
@@ -376,6 +507,8 @@ func getDentryReadWriter(ctx context.Context, d *dentry, offset int64) *dentryRe
 	rw.d = d
 	rw.off = uint64(offset)
 	rw.direct = false
+	rw.fillCache = false
+	rw.nowait = false
 	return rw
 }
 
@@ -399,7 +532,12 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 	rw.d.handleMu.RLock()
 	h := rw.d.readHandleLocked()
 	if (rw.d.mmapFD.RacyLoad() >= 0 && !rw.d.fs.opts.forcePageCache) || rw.d.fs.opts.interop == InteropModeShared || rw.direct {
-		n, err := h.readToBlocksAt(rw.ctx, dsts, rw.off)
+		if rw.nowait {
+			// Nothing is cached.
+			rw.d.handleMu.RUnlock()
+			return 0, linuxerr.ErrWouldBlock
+		}
+		n, err := rw.d.readFunc(h)(rw.ctx, dsts, rw.off)
 		rw.d.handleMu.RUnlock()
 		rw.off += n
 		return n, err
@@ -416,6 +554,7 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 		rw.d.dataMu.RLock()
 		dataMuUnlock = rw.d.dataMu.RUnlock
 	}
+	rw.d.touchCachedData()
 
 	// Compute the range to read (limited by file size and overflow-checked).
 	end := rw.d.size.Load()
@@ -458,6 +597,11 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 
 		case gap.Ok():
 			gapMR := gap.Range().Intersect(mr)
+			if rw.nowait {
+				dataMuUnlock()
+				rw.d.handleMu.RUnlock()
+				return done, linuxerr.ErrWouldBlock
+			}
 			if fillCache {
 				// Read into the cache, then re-enter the loop to read from the
 				// cache.
@@ -467,8 +611,9 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 					End:   gapEnd,
 				}
 				optMR := gap.Range()
-				_, err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR), rw.d.size.Load(), mf, usage.PageCache, true /* populate */, h.readToBlocksAt)
+				_, err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR), rw.d.size.Load(), mf, usage.PageCache, true /* populate */, rw.d.readFunc(h))
 				mf.MarkEvictable(rw.d, pgalloc.EvictableRange{optMR.Start, optMR.End})
+				rw.d.updateCachedBytesLocked()
 				seg, gap = rw.d.cache.Find(rw.off)
 				if !seg.Ok() {
 					dataMuUnlock()
@@ -482,7 +627,7 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 			} else {
 				// Read directly from the file.
 				gapDsts := dsts.TakeFirst64(gapMR.Length())
-				n, err := h.readToBlocksAt(rw.ctx, gapDsts, gapMR.Start)
+				n, err := rw.d.readFunc(h)(rw.ctx, gapDsts, gapMR.Start)
 				done += n
 				rw.off += n
 				dsts = dsts.DropFirst64(n)
@@ -535,6 +680,7 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 	// Otherwise write to/through the cache.
 	mf := rw.d.fs.mfp.MemoryFile()
 	rw.d.dataMu.Lock()
+	rw.d.touchCachedData()
 
 	// Compute the range to write (overflow-checked).
 	start := rw.off
@@ -544,9 +690,11 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 	}
 
 	var (
-		done   uint64
-		retErr error
+		done    uint64
+		dirtied uint64
+		retErr  error
 	)
+	fillCache := rw.fillCache && mf.ShouldCacheEvictable()
 	seg, gap := rw.d.cache.Find(rw.off)
 	for rw.off < end {
 		mr := memmap.MappableRange{rw.off, end}
@@ -563,6 +711,7 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 			// Copy to internal mappings.
 			n, err := safemem.CopySeq(ims, srcs)
 			done += n
+			dirtied += n
 			rw.off += n
 			srcs = srcs.DropFirst64(n)
 			rw.d.dirty.MarkDirty(segMR)
@@ -575,11 +724,35 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 			seg, gap = seg.NextNonEmpty()
 
 		case gap.Ok():
-			// Write directly to the file. At present, we never fill the cache
-			// when writing, since doing so can convert small writes into
-			// inefficient read-modify-write cycles, and we have no mechanism
-			// for detecting or avoiding this.
 			gapMR := gap.Range().Intersect(mr)
+			if fillCache {
+				// Read the pages touched by the write into the cache, then
+				// re-enter the loop to write to the cache. Pages beyond EOF
+				// are zero-filled without reading the remote file, so this
+				// only needs a readable handle for writes within the file.
+				gapEnd, _ := hostarch.PageRoundUp(gapMR.End)
+				reqMR := memmap.MappableRange{
+					Start: hostarch.PageRoundDown(gapMR.Start),
+					End:   gapEnd,
+				}
+				rh := rw.d.readHandleLocked()
+				if size := rw.d.size.Load(); rh.isOpen() || reqMR.Start >= size {
+					_, err := rw.d.cache.Fill(rw.ctx, reqMR, reqMR, size, mf, usage.PageCache, false /* populate */, rw.d.readFunc(rh))
+					mf.MarkEvictable(rw.d, pgalloc.EvictableRange{reqMR.Start, reqMR.End})
+					rw.d.updateCachedBytesLocked()
+					seg, gap = rw.d.cache.Find(rw.off)
+					if !seg.Ok() {
+						retErr = err
+						goto exitLoop
+					}
+					continue
+				}
+			}
+
+			// Write directly to the file. Outside of write-back caching, we
+			// never fill the cache when writing, since doing so can convert
+			// small writes into inefficient read-modify-write cycles, and we
+			// have no mechanism for detecting or avoiding this.
 			gapSrcs := srcs.TakeFirst64(gapMR.Length())
 			n, err := h.writeFromBlocksAt(rw.ctx, gapSrcs, gapMR.Start)
 			done += n
@@ -616,6 +789,9 @@ exitLoop:
 	}
 	rw.d.dataMu.Unlock()
 	rw.d.handleMu.RUnlock()
+	if rw.d.fs.wb != nil && dirtied != 0 {
+		rw.d.fs.wb.markDirty(rw.d, dirtied)
+	}
 	return done, retErr
 }
 
@@ -669,9 +845,14 @@ func regularFileSeekLocked(ctx context.Context, d *dentry, fdOffset, offset int6
 				return 0, err
 			}
 		}
+		if whence == linux.SEEK_DATA || whence == linux.SEEK_HOLE {
+			if off, ok, err := d.seekDataOrHoleHost(ctx, offset, whence); ok {
+				return off, err
+			}
+		}
 		size := int64(d.size.Load())
-		// For SEEK_DATA and SEEK_HOLE, treat the file as a single contiguous
-		// block of data.
+		// Without a host FD, treat the file as a single contiguous block of
+		// data for SEEK_DATA and SEEK_HOLE.
 		switch whence {
 		case linux.SEEK_END:
 			offset += size
@@ -695,6 +876,29 @@ func regularFileSeekLocked(ctx context.Context, d *dentry, fdOffset, offset int6
 	return offset, nil
 }
 
+// seekDataOrHoleHost performs lseek(SEEK_DATA) or lseek(SEEK_HOLE), as
+// specified by whence, on the host FD for d, so that holes in the remote
+// file are reflected. It returns false if d has no host FD.
+func (d *dentry) seekDataOrHoleHost(ctx context.Context, offset int64, whence int32) (int64, bool, error) {
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	fd := d.readFD.RacyLoad()
+	if fd < 0 {
+		return 0, false, nil
+	}
+	// Dirty cached data may fill holes in the remote file.
+	if h := d.writeHandleLocked(); h.isOpen() {
+		d.dataMu.Lock()
+		err := fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt)
+		d.dataMu.Unlock()
+		if err != nil {
+			return 0, true, err
+		}
+	}
+	off, err := unix.Seek(int(fd), offset, int(whence))
+	return off, true, err
+}
+
 // Sync implements vfs.FileDescriptionImpl.Sync.
 func (fd *regularFileFD) Sync(ctx context.Context) error {
 	return fd.dentry().syncCachedFile(ctx, false /* forFilesystemSync */)
@@ -805,6 +1009,13 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 		}, nil
 	}
 
+	if d.fs.opts.hostSHM {
+		// Caching pages in the sentry would silently break coherence with
+		// processes outside the sandbox that map the same host file.
+		d.handleMu.RUnlock()
+		return nil, &memmap.BusError{linuxerr.EIO}
+	}
+
 	d.dataMu.Lock()
 
 	// Constrain translations to d.size (rounded up) to prevent translation to
@@ -826,7 +1037,8 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 
 	mf := d.fs.mfp.MemoryFile()
 	h := d.readHandleLocked()
-	_, cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional), d.size.Load(), mf, usage.PageCache, true /* populate */, h.readToBlocksAt)
+	_, cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional), d.size.Load(), mf, usage.PageCache, true /* populate */, d.readFunc(h))
+	d.updateCachedBytesLocked()
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -843,6 +1055,9 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 			// mapping at any time.
 			d.dirty.KeepDirty(segMR)
 			perms.Write = true
+			if d.fs.wb != nil {
+				d.fs.wb.markDirty(d, segMR.Length())
+			}
 		}
 		ts = append(ts, memmap.Translation{
 			Source: segMR,
@@ -909,6 +1124,7 @@ func (d *dentry) InvalidateUnsavable(ctx context.Context) error {
 	// been returned after we invalidated all existing translations above.
 	d.cache.DropAll(mf)
 	d.dirty.RemoveAll()
+	d.updateCachedBytesLocked()
 
 	return nil
 }
@@ -934,9 +1150,42 @@ func (d *dentry) Evict(ctx context.Context, er pgalloc.EvictableRange) {
 		if err := fsutil.SyncDirty(ctx, mgapMR, &d.cache, &d.dirty, d.size.Load(), mf, h.writeFromBlocksAt); err != nil {
 			log.Warningf("Failed to writeback cached data %v: %v", mgapMR, err)
 		}
+		for seg := d.cache.LowerBoundSegment(mgapMR.Start); seg.Ok() && seg.Start() < mgapMR.End; seg = seg.NextSegment() {
+			d.evicted.MarkDirty(seg.Range().Intersect(mgapMR))
+		}
 		d.cache.Drop(mgapMR, mf)
 		d.dirty.KeepClean(mgapMR)
 	}
+	d.updateCachedBytesLocked()
+}
+
+// CacheStat implements memmap.CachedMappable.CacheStat.
+func (d *dentry) CacheStat(mr memmap.MappableRange) memmap.CacheStat {
+	d.dataMu.RLock()
+	defer d.dataMu.RUnlock()
+	var cs memmap.CacheStat
+	// Ignore anything left beyond EOF, in particular in d.evicted.
+	if end, ok := hostarch.PageRoundUp(d.size.Load()); ok && end < mr.End {
+		mr.End = end
+	}
+	if mr.Start >= mr.End {
+		return cs
+	}
+	cs.Cache = d.cache.SpanRange(mr) / hostarch.PageSize
+	cs.Dirty = d.dirty.SpanRange(mr) / hostarch.PageSize
+	for seg := d.evicted.LowerBoundSegment(mr.Start); seg.Ok() && seg.Start() < mr.End; seg = seg.NextSegment() {
+		// Don't count pages that have been cached again since.
+		emr := seg.Range().Intersect(mr)
+		cs.Evicted += (emr.Length() - d.cache.SpanRange(emr)) / hostarch.PageSize
+	}
+	return cs
+}
+
+// CachedRanges implements memmap.CachedMappable.CachedRanges.
+func (d *dentry) CachedRanges(mr memmap.MappableRange, fn func(memmap.MappableRange)) {
+	d.dataMu.RLock()
+	defer d.dataMu.RUnlock()
+	d.cache.ForEachRange(mr, fn)
 }
 
 // dentryPlatformFile implements memmap.File. It exists solely because dentry
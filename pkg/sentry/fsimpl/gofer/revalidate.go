@@ -234,6 +234,14 @@ func (fs *filesystem) revalidateHelper(ctx context.Context, vfsObj *vfs.VirtualF
 	if len(state.names) == 0 {
 		return nil
 	}
+	if state.delegated() {
+		return nil
+	}
+	// Request delegations before getting attributes, so that the attributes
+	// are covered by them.
+	fs.delegate(ctx, state.dentries)
+	state.loadParentDelegations()
+
 	// Lock metadata on all dentries *before* getting attributes for them.
 	state.lockAllMetadata()
 
@@ -244,8 +252,15 @@ func (fs *filesystem) revalidateHelper(ctx context.Context, vfsObj *vfs.VirtualF
 	)
 	if fs.opts.lisaEnabled {
 		var err error
-		statsLisa, err = state.start.controlFDLisa.WalkStat(ctx, state.names)
+		if state.start.directfs != nil {
+			statsLisa, err = state.start.directfs.walkStat(ctx, state.names)
+		} else {
+			statsLisa, err = state.start.controlFDLisa.WalkStat(ctx, state.names)
+		}
 		if err != nil {
+			// The delegations requested above may not be relied upon
+			// without fresh attributes.
+			state.forgetDelegations()
 			return err
 		}
 		numStats = len(statsLisa)
@@ -336,6 +351,7 @@ func (fs *filesystem) revalidateHelper(ctx context.Context, vfsObj *vfs.VirtualF
 		// The file at this path hasn't changed. Just update cached metadata.
 		if fs.opts.lisaEnabled {
 			d.updateFromLisaStatLocked(&statsLisa[i]) // +checklocksforce: see above.
+			d.delegatedAt.Store(state.parentDelegations[i])
 		} else {
 			d.updateFromP9AttrsLocked(stats[i].Valid, &stats[i].Attr) // +checklocksforce: see above.
 		}
@@ -370,6 +386,10 @@ type revalidateState struct {
 	// dentry.metadataMu is acquired as each dentry is added to this list.
 	dentries []*dentry
 
+	// parentDelegations are the generation numbers of the delegations held by
+	// the parents of dentries when their attributes were requested.
+	parentDelegations []uint64
+
 	// locked indicates if metadata lock has been acquired on dentries.
 	locked bool
 }
@@ -394,6 +414,43 @@ func (r *revalidateState) add(name string, d *dentry) {
 	r.dentries = append(r.dentries, d)
 }
 
+// delegated returns true if delegations guarantee that all dentries in r are
+// up to date, so that they don't need to be revalidated.
+//
+// Preconditions: The filesystem's renameMu must be locked.
+func (r *revalidateState) delegated() bool {
+	for i, d := range r.dentries {
+		if !d.metadataDelegated() {
+			return false
+		}
+		if len(r.names[i]) != 0 && !d.lookupDelegated() {
+			return false
+		}
+	}
+	return true
+}
+
+// loadParentDelegations initializes r.parentDelegations.
+//
+// Preconditions: The filesystem's renameMu must be locked.
+func (r *revalidateState) loadParentDelegations() {
+	for _, d := range r.dentries {
+		var gen uint64
+		if d.parent != nil {
+			gen = d.parent.delegation.Load()
+		}
+		r.parentDelegations = append(r.parentDelegations, gen)
+	}
+}
+
+// forgetDelegations stops tracking the delegations held on the directories in
+// r.
+func (r *revalidateState) forgetDelegations() {
+	for _, d := range r.dentries {
+		d.forgetDelegation()
+	}
+}
+
 // +checklocksignore
 func (r *revalidateState) lockAllMetadata() {
 	for _, d := range r.dentries {
@@ -425,4 +482,5 @@ func (r *revalidateState) reset() {
 	r.start = nil
 	r.names = r.names[:0]
 	r.dentries = r.dentries[:0]
+	r.parentDelegations = r.parentDelegations[:0]
 }
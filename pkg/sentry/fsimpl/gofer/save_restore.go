@@ -51,6 +51,9 @@ func (fs *filesystem) PrepareSave(ctx context.Context) error {
 	if len(fs.iopts.UniqueID) == 0 {
 		return fmt.Errorf("gofer.filesystem with no UniqueID cannot be saved")
 	}
+	if fs.root.directfs != nil {
+		return fmt.Errorf("gofer.filesystem using directfs cannot be saved")
+	}
 
 	// Purge cached dentries, which may not be reopenable after restore due to
 	// permission changes.
@@ -58,6 +61,12 @@ func (fs *filesystem) PrepareSave(ctx context.Context) error {
 	fs.evictAllCachedDentriesLocked(ctx)
 	fs.renameMu.Unlock()
 
+	if fs.opts.hostSHM {
+		if err := fs.checkHostSHMSavable(); err != nil {
+			return err
+		}
+	}
+
 	// Buffer pipe data so that it's available for reading after restore. (This
 	// is a legacy VFS1 feature.)
 	fs.syncMu.Lock()
@@ -71,6 +80,16 @@ func (fs *filesystem) PrepareSave(ctx context.Context) error {
 	}
 	fs.syncMu.Unlock()
 
+	// Stop background writeback, which would otherwise race with saving
+	// dentries' caches.
+	if fs.wb != nil {
+		fs.wb.pause()
+	}
+
+	// Wait for readahead, which would likewise race with saving dentries'
+	// caches. Since the kernel is stopped, no more readahead can start.
+	fs.readaheads.Wait()
+
 	// Flush local state to the remote filesystem.
 	if err := fs.Sync(ctx); err != nil {
 		return err
@@ -80,6 +99,31 @@ func (fs *filesystem) PrepareSave(ctx context.Context) error {
 	return fs.root.prepareSaveRecursive(ctx)
 }
 
+// checkHostSHMSavable returns an error if a memory-mapped file on a host_shm
+// filesystem can't be reconnected to the same host file after restore.
+//
+// Preconditions: fs.opts.hostSHM.
+func (fs *filesystem) checkHostSHMSavable() error {
+	fs.syncMu.Lock()
+	defer fs.syncMu.Unlock()
+	for elem := fs.syncableDentries.Front(); elem != nil; elem = elem.Next() {
+		d := elem.d
+		if !d.isRegularFile() || !d.isDeleted() {
+			continue
+		}
+		d.mapsMu.Lock()
+		mapped := !d.mappings.IsEmpty()
+		d.mapsMu.Unlock()
+		if mapped {
+			// Deleted files can't be reopened by path after restore, and
+			// copying their contents into the checkpoint would break coherence
+			// with processes outside the sandbox.
+			return fmt.Errorf("gofer.filesystem: host shared memory file %q is deleted but memory-mapped, and can't be saved", genericDebugPathname(d))
+		}
+	}
+	return nil
+}
+
 // Preconditions:
 //   - fd represents a pipe.
 //   - fd is readable.
@@ -155,6 +199,12 @@ func (d *dentry) afterLoad() {
 	if d.refs.Load() != -1 {
 		refsvfs2.Register(d)
 	}
+	for _, child := range d.children {
+		if child == nil {
+			negativeDentries.track(d)
+			break
+		}
+	}
 }
 
 // afterLoad is invoked by stateify.
@@ -187,8 +237,10 @@ func (fs *filesystem) CompleteRestore(ctx context.Context, opts vfs.CompleteRest
 		return fmt.Errorf("no server FD available for filesystem with unique ID %q", fs.iopts.UniqueID)
 	}
 	fs.opts.fd = fd
+	fs.registerDentryCache()
 	fs.inoByQIDPath = make(map[uint64]uint64)
 	fs.inoByKey = make(map[inoKey]uint64)
+	fs.restoreFileHandles()
 
 	if fs.opts.lisaEnabled {
 		rootInode, err := fs.initClientLisa(ctx)
@@ -198,6 +250,7 @@ func (fs *filesystem) CompleteRestore(ctx context.Context, opts vfs.CompleteRest
 		if err := fs.root.restoreFileLisa(ctx, &rootInode, &opts); err != nil {
 			return err
 		}
+		fs.registerReconnectable()
 	} else {
 		if err := fs.dial(ctx); err != nil {
 			return err
@@ -253,6 +306,10 @@ func (fs *filesystem) CompleteRestore(ctx context.Context, opts vfs.CompleteRest
 	// Discard state only required during restore.
 	fs.savedDentryRW = nil
 
+	if fs.opts.writeback {
+		fs.startWriteback()
+	}
+
 	return nil
 }
 
@@ -302,7 +359,7 @@ func (d *dentry) restoreFile(ctx context.Context, file p9file, qid p9.QID, attrM
 		}
 	}
 
-	return nil
+	return d.checkHostSHMRestored()
 }
 
 func (d *dentry) restoreFileLisa(ctx context.Context, inode *lisafs.Inode, opts *vfs.CompleteRestoreOptions) error {
@@ -351,6 +408,21 @@ func (d *dentry) restoreFileLisa(ctx context.Context, inode *lisafs.Inode, opts
 		}
 	}
 
+	return d.checkHostSHMRestored()
+}
+
+// checkHostSHMRestored returns an error if d is a memory-mapped file on a
+// host_shm filesystem, but no host FD is available to map it after restore.
+func (d *dentry) checkHostSHMRestored() error {
+	if !d.fs.opts.hostSHM || !d.isRegularFile() {
+		return nil
+	}
+	d.mapsMu.Lock()
+	mapped := !d.mappings.IsEmpty()
+	d.mapsMu.Unlock()
+	if mapped && d.mmapFD.Load() < 0 {
+		return fmt.Errorf("gofer.dentry(%q).restoreFile: host shared memory file is memory-mapped, but no host FD is available", genericDebugPathname(d))
+	}
 	return nil
 }
 
@@ -0,0 +1,329 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"math"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/shrinker"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// negativeDentryBytes is the approximate memory used by a cached negative
+// lookup, excluding its name: a map entry in dentry.children.
+const negativeDentryBytes = 48
+
+// maxCachedDentriesPerMount is the maximum number of unreferenced dentries
+// cached by each filesystem that doesn't use globalDentryCache. It is only
+// mutated during sandbox initialization, before any filesystems are created.
+var maxCachedDentriesPerMount uint64 = defaultMaxCachedDentries
+
+// SetMaxCachedDentriesPerMount sets the maximum number of unreferenced
+// dentries cached by each gofer mount that doesn't use the global dentry cache
+// (see SetDentryCacheSize). It must be called before any gofer filesystems are
+// created.
+func SetMaxCachedDentriesPerMount(n int) {
+	if n < 0 {
+		return
+	}
+	maxCachedDentriesPerMount = uint64(n)
+}
+
+// maxCachedFileBytes is the maximum number of bytes of regular file data
+// cached by all gofer filesystems, or 0 if unlimited.
+var maxCachedFileBytes atomicbitops.Uint64
+
+// SetMaxCachedFileBytes sets the maximum number of bytes of regular file data
+// cached by all gofer mounts. Once exceeded, the least recently used files'
+// cached data is written back and dropped. 0 means unlimited.
+func SetMaxCachedFileBytes(n uint64) {
+	maxCachedFileBytes.Store(n)
+}
+
+// Usage implements shrinker.Cache.Usage.
+func (c *dentryCache) Usage() (objects, bytes uint64) {
+	c.mu.Lock()
+	n := c.dentriesLen
+	c.mu.Unlock()
+	return n, n * dentrySize
+}
+
+// Shrink implements shrinker.Cache.Shrink.
+func (c *dentryCache) Shrink(ctx context.Context, target uint64) uint64 {
+	var evicted uint64
+	for {
+		c.mu.Lock()
+		if c.dentriesLen*dentrySize <= target {
+			c.mu.Unlock()
+			return evicted
+		}
+		victim := c.dentries.Back()
+		c.mu.Unlock()
+		if victim == nil {
+			return evicted
+		}
+		// If victim has gained references since it was cached, evict just
+		// removes it from c.
+		victim.d.evict(ctx)
+		if victim.d.refs.Load() == -1 {
+			evicted++
+		}
+	}
+}
+
+// registerDentryCache registers fs.dentryCache with package shrinker, if no
+// other filesystem sharing it has done so.
+func (fs *filesystem) registerDentryCache() {
+	if fs.dentryCacheRegistered {
+		return
+	}
+	fs.dentryCacheRegistered = true
+	c := fs.dentryCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.registrations == 0 {
+		c.unregister = shrinker.Register(shrinker.Dentries, c)
+	}
+	c.registrations++
+}
+
+// unregisterDentryCache undoes registerDentryCache.
+func (fs *filesystem) unregisterDentryCache() {
+	if !fs.dentryCacheRegistered {
+		return
+	}
+	fs.dentryCacheRegistered = false
+	c := fs.dentryCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.registrations--
+	if c.registrations == 0 {
+		c.unregister()
+		c.unregister = nil
+	}
+}
+
+// negativeDentryCache tracks directories that cache negative lookups, i.e.
+// that have nil entries in dentry.children.
+type negativeDentryCache struct {
+	// mu protects dirs.
+	mu sync.Mutex
+
+	// dirs contains directories that may have nil children.
+	dirs map[*dentry]struct{}
+}
+
+var negativeDentries = negativeDentryCache{
+	dirs: make(map[*dentry]struct{}),
+}
+
+func init() {
+	shrinker.Register(shrinker.NegativeDentries, &negativeDentries)
+	shrinker.Register(shrinker.FilePages, &filePages)
+}
+
+// track records that d has cached a negative lookup.
+//
+// Preconditions: d.dirMu must be locked.
+func (c *negativeDentryCache) track(d *dentry) {
+	d.touchNegativeLookups()
+	c.mu.Lock()
+	c.dirs[d] = struct{}{}
+	c.mu.Unlock()
+}
+
+// touchNegativeLookups records that a negative lookup was served from
+// d.children.
+func (d *dentry) touchNegativeLookups() {
+	d.negativeUse.Store(metric.CheapNowNano())
+}
+
+// untrack stops tracking d.
+func (c *negativeDentryCache) untrack(d *dentry) {
+	c.mu.Lock()
+	delete(c.dirs, d)
+	c.mu.Unlock()
+}
+
+// snapshot returns the tracked directories.
+func (c *negativeDentryCache) snapshot() []*dentry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ds := make([]*dentry, 0, len(c.dirs))
+	for d := range c.dirs {
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+// negativeChildrenLocked returns the number of nil children of d, and the
+// approximate memory that they use.
+//
+// Preconditions: d.dirMu must be locked.
+func (d *dentry) negativeChildrenLocked() (objects, bytes uint64) {
+	for name, child := range d.children {
+		if child == nil {
+			objects++
+			bytes += negativeDentryBytes + uint64(len(name))
+		}
+	}
+	return objects, bytes
+}
+
+// Usage implements shrinker.Cache.Usage.
+func (c *negativeDentryCache) Usage() (objects, bytes uint64) {
+	for _, d := range c.snapshot() {
+		d.dirMu.Lock()
+		o, b := d.negativeChildrenLocked()
+		d.dirMu.Unlock()
+		objects += o
+		bytes += b
+	}
+	return objects, bytes
+}
+
+// Shrink implements shrinker.Cache.Shrink.
+func (c *negativeDentryCache) Shrink(ctx context.Context, target uint64) uint64 {
+	_, total := c.Usage()
+	ds := c.snapshot()
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].negativeUse.Load() < ds[j].negativeUse.Load()
+	})
+	var evicted uint64
+	for _, d := range ds {
+		if total <= target {
+			break
+		}
+		d.dirMu.Lock()
+		for name, child := range d.children {
+			if child == nil {
+				delete(d.children, name)
+				evicted++
+				freed := negativeDentryBytes + uint64(len(name))
+				if freed > total {
+					freed = total
+				}
+				total -= freed
+			}
+		}
+		c.untrack(d)
+		d.dirMu.Unlock()
+	}
+	return evicted
+}
+
+// filePageCache tracks dentries with cached regular file data.
+type filePageCache struct {
+	// mu protects dentries.
+	mu sync.Mutex
+
+	// dentries contains all dentries with non-zero dentry.cachedBytes.
+	dentries map[*dentry]struct{}
+
+	// bytes is the sum of dentry.cachedBytes over dentries.
+	bytes atomicbitops.Uint64
+
+	// shrinking is 1 while a goroutine started by checkLimit is running.
+	shrinking atomicbitops.Uint32
+}
+
+var filePages = filePageCache{
+	dentries: make(map[*dentry]struct{}),
+}
+
+// touchCachedData records an access to d's cached data.
+func (d *dentry) touchCachedData() {
+	d.cacheUse.Store(metric.CheapNowNano())
+}
+
+// updateCachedBytesLocked must be called after d.cache changes.
+//
+// Preconditions: d.dataMu must be locked for writing.
+func (d *dentry) updateCachedBytesLocked() {
+	newBytes := d.cache.Span()
+	oldBytes := d.cachedBytes
+	if newBytes == oldBytes {
+		return
+	}
+	d.cachedBytes = newBytes
+	c := &filePages
+	c.mu.Lock()
+	if newBytes == 0 {
+		delete(c.dentries, d)
+	} else if oldBytes == 0 {
+		c.dentries[d] = struct{}{}
+	}
+	c.mu.Unlock()
+	c.bytes.Add(newBytes - oldBytes)
+	if newBytes > oldBytes {
+		c.checkLimit()
+	}
+}
+
+// checkLimit starts shrinking c if it exceeds maxCachedFileBytes. Since
+// callers hold locks that eviction requires, shrinking is asynchronous.
+func (c *filePageCache) checkLimit() {
+	max := maxCachedFileBytes.Load()
+	if max == 0 || c.bytes.Load() <= max || !c.shrinking.CompareAndSwap(0, 1) {
+		return
+	}
+	go func() { // S/R-SAFE: only drops cached data, which is not saved.
+		defer c.shrinking.Store(0)
+		if n := c.Shrink(context.Background(), max-max/8); n != 0 {
+			shrinker.RecordEvictions(shrinker.FilePages, n)
+			log.Debugf("Evicted cached data of %d gofer files over the %d byte limit", n, max)
+		}
+	}()
+}
+
+// Usage implements shrinker.Cache.Usage.
+func (c *filePageCache) Usage() (objects, bytes uint64) {
+	c.mu.Lock()
+	objects = uint64(len(c.dentries))
+	c.mu.Unlock()
+	return objects, c.bytes.Load()
+}
+
+// Shrink implements shrinker.Cache.Shrink. Only data that is not
+// memory-mapped is evicted.
+func (c *filePageCache) Shrink(ctx context.Context, target uint64) uint64 {
+	c.mu.Lock()
+	ds := make([]*dentry, 0, len(c.dentries))
+	for d := range c.dentries {
+		ds = append(ds, d)
+	}
+	c.mu.Unlock()
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].cacheUse.Load() < ds[j].cacheUse.Load()
+	})
+	var evicted uint64
+	for _, d := range ds {
+		if c.bytes.Load() <= target {
+			break
+		}
+		before := c.bytes.Load()
+		d.Evict(ctx, pgalloc.EvictableRange{0, math.MaxUint64})
+		if c.bytes.Load() < before {
+			evicted++
+		}
+	}
+	return evicted
+}
@@ -30,6 +30,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
 	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/usermem"
@@ -201,7 +202,7 @@ func (fd *specialFileFD) Epollable() bool {
 func (fd *specialFileFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
 	if fd.isRegularFile {
 		d := fd.dentry()
-		return d.doAllocate(ctx, offset, length, func() error {
+		return d.doAllocate(ctx, mode, offset, length, func() error {
 			if d.fs.opts.lisaEnabled {
 				return fd.handle.fdLisa.Allocate(ctx, mode, offset, length)
 			}
@@ -239,6 +240,10 @@ func (fd *specialFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		d.touchAtime(fd.vfsfd.Mount())
 	}
 
+	if fd.isRegularFile {
+		usage.ThrottleIO(ctx, false /* write */, dst.NumBytes())
+	}
+
 	bufN := int64(0)
 	if fd.haveBuf.Load() != 0 {
 		var err error
@@ -269,6 +274,9 @@ func (fd *specialFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 	if linuxerr.Equals(linuxerr.EAGAIN, err) {
 		err = linuxerr.ErrWouldBlock
 	}
+	if fd.isRegularFile {
+		usage.AccountIO(ctx, usage.IOSourceGofer, false /* write */, bufN+n)
+	}
 	return bufN + n, err
 }
 
@@ -307,6 +315,8 @@ func (fd *specialFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 	d := fd.dentry()
 	if fd.isRegularFile {
+		usage.ThrottleIO(ctx, true /* write */, src.NumBytes())
+
 		// If the regular file fd was opened with O_APPEND, make sure the file
 		// size is updated. There is a possible race here if size is modified
 		// externally after metadata cache is updated.
@@ -356,6 +366,9 @@ func (fd *specialFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 	rw := getHandleReadWriter(ctx, &fd.handle, offset)
 	n, err := src.CopyInTo(ctx, rw)
 	putHandleReadWriter(rw)
+	if fd.isRegularFile {
+		usage.AccountIO(ctx, usage.IOSourceGofer, true /* write */, n)
+	}
 	if n > 0 && fd.vfsfd.StatusFlags()&(linux.O_DSYNC|linux.O_SYNC) != 0 {
 		// Note that if syncing the remote file fails, then we can't guarantee that
 		// any data was actually written with the semantics of O_DSYNC or
@@ -37,7 +37,9 @@ func (d *dentry) readlink(ctx context.Context, mnt *vfs.Mount) (string, error) {
 	}
 	var target string
 	var err error
-	if d.fs.opts.lisaEnabled {
+	if d.directfs != nil {
+		target, err = d.directfs.readlink(ctx)
+	} else if d.fs.opts.lisaEnabled {
 		target, err = d.controlFDLisa.ReadLinkAt(ctx)
 	} else {
 		target, err = d.file.readlink(ctx)
@@ -0,0 +1,310 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/merkletree"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// On verity mounts (filesystemOptions.verityRootHash != nil), the filesystem is
+// read-only, and every file is checked against a tree file generated by
+// "runsc verity-measure" before it is used. Tree files are authenticated by
+// the listing of their parent directory, and the root directory's tree file
+// is authenticated by the root hash given as a mount option, so no data from
+// the remote filesystem is trusted. Integrity violations are logged and
+// reported to the application as EIO. See pkg/merkletree for the format of
+// tree files.
+
+// verityState is the verified state of a dentry on a verity mount.
+//
+// +stateify savable
+type verityState struct {
+	// If the dentry represents a regular file, size is the size of its data,
+	// and tree is its Merkle tree, which has been checked against its
+	// descriptor.
+	size int64
+	tree []byte
+
+	// If the dentry represents a directory, children maps the names of its
+	// children to the digests of their descriptors.
+	children map[string][]byte
+}
+
+// verityError logs an integrity violation on fs, and returns the error that
+// is reported to the application.
+func (fs *filesystem) verityError(pathname string, format string, v ...interface{}) error {
+	log.Warningf("gofer.filesystem: VERITY INTEGRITY VIOLATION on %q (aname %q): %s", pathname, fs.opts.aname, fmt.Sprintf(format, v...))
+	return linuxerr.EIO
+}
+
+// initVerityRoot verifies fs.root against fs.opts.verityRootHash.
+func (fs *filesystem) initVerityRoot(ctx context.Context) error {
+	if !fs.root.isDir() {
+		ctx.Warningf("gofer.filesystem: verity mounts must have a directory as their root")
+		return linuxerr.EINVAL
+	}
+	var ds *[]*dentry
+	fs.renameMu.RLock()
+	defer fs.renameMuRUnlockAndCheckCaching(ctx, &ds)
+	fs.root.dirMu.Lock()
+	defer fs.root.dirMu.Unlock()
+	return fs.verifyDentryLocked(ctx, fs.root, "", fs.root, fs.opts.verityRootHash, &ds)
+}
+
+// getVerityChildLocked implements getChildLocked for filesystems on verity
+// mounts, verifying the child against parent's listing the first time it is
+// looked up.
+//
+// Preconditions: Same as getChildLocked, and parent.verity != nil.
+func (fs *filesystem) getVerityChildLocked(ctx context.Context, parent *dentry, name string, ds **[]*dentry) (*dentry, error) {
+	if merkletree.IsTreeFileName(name) {
+		return nil, linuxerr.ENOENT
+	}
+	digest, measured := parent.verity.children[name]
+	child, err := fs.lookupChildLocked(ctx, parent, name, ds)
+	if err != nil {
+		if measured && linuxerr.Equals(linuxerr.ENOENT, err) {
+			return nil, fs.verityError(genericDebugPathname(parent), "measured child %q is missing", name)
+		}
+		return nil, err
+	}
+	if !measured {
+		return nil, fs.verityError(genericDebugPathname(parent), "child %q was not measured", name)
+	}
+	if child.verity == nil {
+		if err := fs.verifyDentryLocked(ctx, parent, name, child, digest, ds); err != nil {
+			return nil, err
+		}
+	}
+	return child, nil
+}
+
+// verifyDentryLocked checks d, which is the child of dir with the given name
+// (or dir itself if name is empty), against the tree file in dir and the
+// given descriptor digest, and sets d.verity if successful.
+//
+// Preconditions:
+//   - fs.renameMu must be locked.
+//   - dir.dirMu must be locked.
+func (fs *filesystem) verifyDentryLocked(ctx context.Context, dir *dentry, name string, d *dentry, digest []byte, ds **[]*dentry) error {
+	pathname := genericDebugPathname(d)
+	desc, payload, err := fs.readTreeFileLocked(ctx, dir, name, pathname, digest, ds)
+	if err != nil {
+		return err
+	}
+	if mode := d.mode.Load(); mode != desc.Mode {
+		return fs.verityError(pathname, "mode is %#o, want %#o", mode, desc.Mode)
+	}
+	// The tree records owners as stored on the remote filesystem.
+	if uid, gid, wantUID, wantGID := d.uid.Load(), d.gid.Load(), fs.mountUID(desc.UID), fs.mountGID(desc.GID); uid != wantUID || gid != wantGID {
+		return fs.verityError(pathname, "owner is %d:%d, want %d:%d", uid, gid, wantUID, wantGID)
+	}
+
+	vs := &verityState{}
+	switch d.fileType() {
+	case linux.S_IFREG:
+		if size := d.size.Load(); size != uint64(desc.Size) {
+			return fs.verityError(pathname, "size is %d, want %d", size, desc.Size)
+		}
+		if err := merkletree.VerifyTree(merkletree.NewLayout(desc.Size), payload, desc.Root); err != nil {
+			return fs.verityError(pathname, "%v", err)
+		}
+		vs.size = desc.Size
+		vs.tree = payload
+	case linux.S_IFDIR, linux.S_IFLNK:
+		_, root, err := merkletree.Generate(bytes.NewReader(payload), desc.Size)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(root, desc.Root) {
+			return fs.verityError(pathname, "%v: payload", merkletree.ErrMismatch)
+		}
+		if d.isDir() {
+			ents, err := merkletree.DecodeDirectory(payload)
+			if err != nil {
+				return fs.verityError(pathname, "%v", err)
+			}
+			vs.children = make(map[string][]byte, len(ents))
+			for _, ent := range ents {
+				vs.children[ent.Name] = ent.Digest
+			}
+		} else {
+			// Symlinks are only ever resolved by the sentry, so serving the
+			// measured target is sufficient.
+			d.dataMu.Lock()
+			d.haveTarget = true
+			d.target = string(payload)
+			d.dataMu.Unlock()
+		}
+	}
+	d.verity = vs
+	return nil
+}
+
+// readTreeFileLocked reads the tree file for the child of dir with the given
+// name, checks its descriptor against digest, and returns the descriptor and
+// payload.
+//
+// Preconditions:
+//   - fs.renameMu must be locked.
+//   - dir.dirMu must be locked.
+func (fs *filesystem) readTreeFileLocked(ctx context.Context, dir *dentry, name, pathname string, digest []byte, ds **[]*dentry) (merkletree.Descriptor, []byte, error) {
+	tf, err := fs.lookupChildLocked(ctx, dir, merkletree.TreeFileName(name), ds)
+	if err != nil {
+		if linuxerr.Equals(linuxerr.ENOENT, err) {
+			return merkletree.Descriptor{}, nil, fs.verityError(pathname, "tree file is missing")
+		}
+		return merkletree.Descriptor{}, nil, err
+	}
+	if !tf.isRegularFile() {
+		return merkletree.Descriptor{}, nil, fs.verityError(pathname, "tree file is not a regular file")
+	}
+	if err := tf.ensureSharedHandle(ctx, true /* read */, false /* write */, false /* trunc */); err != nil {
+		return merkletree.Descriptor{}, nil, err
+	}
+
+	buf := make([]byte, merkletree.DescriptorSize)
+	if err := tf.readFullAt(ctx, buf, 0); err != nil {
+		return merkletree.Descriptor{}, nil, fs.verityError(pathname, "reading tree file: %v", err)
+	}
+	desc, err := merkletree.DecodeDescriptor(buf)
+	if err != nil {
+		return merkletree.Descriptor{}, nil, fs.verityError(pathname, "%v", err)
+	}
+	if !bytes.Equal(desc.Digest(), digest) {
+		return merkletree.Descriptor{}, nil, fs.verityError(pathname, "%v: descriptor", merkletree.ErrMismatch)
+	}
+
+	// desc is now trusted, so it can be used to size the payload.
+	payloadSize := desc.Size
+	if linux.FileMode(desc.Mode).FileType() == linux.ModeRegular {
+		payloadSize = merkletree.NewLayout(desc.Size).TreeSize()
+	}
+	if size := tf.size.Load(); size != uint64(merkletree.DescriptorSize+payloadSize) {
+		return merkletree.Descriptor{}, nil, fs.verityError(pathname, "tree file has size %d, want %d", size, merkletree.DescriptorSize+payloadSize)
+	}
+	payload := make([]byte, payloadSize)
+	if err := tf.readFullAt(ctx, payload, merkletree.DescriptorSize); err != nil {
+		return merkletree.Descriptor{}, nil, fs.verityError(pathname, "reading tree file: %v", err)
+	}
+	return desc, payload, nil
+}
+
+// readFullAt reads len(buf) bytes at offset off from d's shared read handle.
+func (d *dentry) readFullAt(ctx context.Context, buf []byte, off uint64) error {
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	h := d.readHandleLocked()
+	for done := 0; done < len(buf); {
+		n, err := h.readToBlocksAt(ctx, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf[done:])), off+uint64(done))
+		done += int(n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("short read: got %d bytes, want %d", done, len(buf))
+		}
+	}
+	return nil
+}
+
+// readFunc returns a function that reads from h, which must be a handle for
+// d, in the same way as handle.readToBlocksAt. If d is on a verity mount, the
+// returned function only returns data that has been verified against d's
+// Merkle tree.
+func (d *dentry) readFunc(h handle) func(context.Context, safemem.BlockSeq, uint64) (uint64, error) {
+	if d.verity == nil {
+		return h.readToBlocksAt
+	}
+	return func(ctx context.Context, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+		return d.verity.readToBlocksAt(ctx, d, h, dsts, offset)
+	}
+}
+
+// readToBlocksAt reads from h into dsts at offset, verifying whole blocks of
+// d's data against vs.tree before copying out the requested range.
+func (vs *verityState) readToBlocksAt(ctx context.Context, d *dentry, h handle, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+	if dsts.IsEmpty() || offset >= uint64(vs.size) {
+		return 0, nil
+	}
+	end := offset + dsts.NumBytes()
+	if end < offset || end > uint64(vs.size) {
+		end = uint64(vs.size)
+	}
+	start := offset &^ (merkletree.BlockSize - 1)
+	blocksEnd := (end + merkletree.BlockSize - 1) &^ (merkletree.BlockSize - 1)
+	if blocksEnd > uint64(vs.size) {
+		blocksEnd = uint64(vs.size)
+	}
+	buf := make([]byte, blocksEnd-start)
+	for done := 0; done < len(buf); {
+		n, err := h.readToBlocksAt(ctx, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf[done:])), start+uint64(done))
+		done += int(n)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, d.fs.verityError(genericDebugPathname(d), "short read at offset %d", start+uint64(done))
+		}
+	}
+	if err := merkletree.VerifyData(merkletree.NewLayout(vs.size), vs.tree, int64(start), buf); err != nil {
+		return 0, d.fs.verityError(genericDebugPathname(d), "%v", err)
+	}
+	return safemem.CopySeq(dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf[offset-start:end-start])))
+}
+
+// verifyDirents removes tree files from dirents, which were read from d on a
+// verity mount, and checks that the remaining entries match d's listing.
+func (d *dentry) verifyDirents(dirents []vfs.Dirent) ([]vfs.Dirent, error) {
+	filtered := dirents[:0]
+	seen := make(map[string]struct{}, len(d.verity.children))
+	for _, dirent := range dirents {
+		switch {
+		case dirent.Name == "." || dirent.Name == "..":
+		case merkletree.IsTreeFileName(dirent.Name):
+			continue
+		default:
+			if _, ok := d.verity.children[dirent.Name]; !ok {
+				return nil, d.fs.verityError(genericDebugPathname(d), "child %q was not measured", dirent.Name)
+			}
+			seen[dirent.Name] = struct{}{}
+		}
+		dirent.NextOff = int64(len(filtered) + 1)
+		filtered = append(filtered, dirent)
+	}
+	if len(seen) != len(d.verity.children) {
+		return nil, d.fs.verityError(genericDebugPathname(d), "%d measured children are missing", len(d.verity.children)-len(seen))
+	}
+	return filtered, nil
+}
+
+// checkVerityWrite returns EROFS if d is on a verity mount. Verity mounts
+// should also be read-only in VFS, but the filesystem stays immutable
+// regardless of how it is mounted.
+func (d *dentry) checkVerityWrite() error {
+	if d.fs.opts.verityRootHash != nil {
+		return linuxerr.EROFS
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/uniqueid"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Each gofer filesystem has its own dentries, and thus its own inotify watch
+// sets, so watches on a file mounted in several containers of a sandbox would
+// only see events caused through the same mount. To avoid this, dentries that
+// may have watches are tracked by the host inode they represent, and events
+// generated by the sentry are also delivered to the watches of other dentries
+// for the same inode.
+//
+// Only changes made through the sentry generate events. Changes made on the
+// host, or by another sandbox, are never observed by inotify watches on gofer
+// filesystems, even though inotify_add_watch(2) succeeds. Inodes are
+// identified by host device and inode numbers, which only lisafs provides, so
+// events are not shared between 9P filesystems. Watches restored from a
+// checkpoint are not shared until another watch is added to the same file.
+
+// watchedDentries tracks the dentries that may have inotify watches. It is
+// global because, like globalDentryCache, it is shared by all gofer
+// filesystems.
+var watchedDentries = struct {
+	// mu is never held while acquiring other locks.
+	mu sync.Mutex
+
+	// dentries maps host inodes to the dentries that represent them.
+	// +checklocks:mu
+	dentries map[inoKey]map[*dentry]struct{}
+}{
+	dentries: make(map[inoKey]map[*dentry]struct{}),
+}
+
+// canShareWatches returns true if d's watches may receive events caused
+// through other dentries for the same host inode.
+func (d *dentry) canShareWatches() bool {
+	return d.fs.opts.lisaEnabled && !d.isSynthetic()
+}
+
+// registerWatches adds d to watchedDentries.
+func (d *dentry) registerWatches() {
+	if !d.canShareWatches() {
+		return
+	}
+	watchedDentries.mu.Lock()
+	defer watchedDentries.mu.Unlock()
+	ds := watchedDentries.dentries[d.inoKey]
+	if ds == nil {
+		ds = make(map[*dentry]struct{})
+		watchedDentries.dentries[d.inoKey] = ds
+	}
+	ds[d] = struct{}{}
+}
+
+// unregisterWatches removes d from watchedDentries.
+func (d *dentry) unregisterWatches() {
+	if !d.canShareWatches() {
+		return
+	}
+	watchedDentries.mu.Lock()
+	defer watchedDentries.mu.Unlock()
+	ds := watchedDentries.dentries[d.inoKey]
+	delete(ds, d)
+	if len(ds) == 0 {
+		delete(watchedDentries.dentries, d.inoKey)
+	}
+}
+
+// peerWatches returns the watch sets of the other dentries that represent the
+// same host inode as d.
+func (d *dentry) peerWatches() []*vfs.Watches {
+	if !d.canShareWatches() {
+		return nil
+	}
+	watchedDentries.mu.Lock()
+	defer watchedDentries.mu.Unlock()
+	var ws []*vfs.Watches
+	for peer := range watchedDentries.dentries[d.inoKey] {
+		if peer != d {
+			ws = append(ws, &peer.watches)
+		}
+	}
+	return ws
+}
+
+// notify queues an inotify event with d's watches and those of the other
+// dentries that represent the same host inode. See vfs.Watches.Notify.
+func (d *dentry) notify(ctx context.Context, name string, events, cookie uint32, et vfs.EventType, unlinked bool) {
+	d.watches.Notify(ctx, name, events, cookie, et, unlinked)
+	for _, ws := range d.peerWatches() {
+		ws.Notify(ctx, name, events, cookie, et, unlinked)
+	}
+}
+
+// inotifyRemoveChild is equivalent to vfs.InotifyRemoveChild, but also
+// notifies other dentries for the same host inodes. child may be nil.
+func inotifyRemoveChild(ctx context.Context, child, parent *dentry, name string) {
+	if child != nil {
+		child.notify(ctx, "", linux.IN_ATTRIB, 0, vfs.InodeEvent, true /* unlinked */)
+	}
+	parent.notify(ctx, name, linux.IN_DELETE, 0, vfs.InodeEvent, true /* unlinked */)
+}
+
+// inotifyRename is equivalent to vfs.InotifyRename, but also notifies other
+// dentries for the same host inodes.
+func inotifyRename(ctx context.Context, renamed, oldParent, newParent *dentry, oldName, newName string) {
+	var dirEv uint32
+	if renamed.isDir() {
+		dirEv = linux.IN_ISDIR
+	}
+	cookie := uniqueid.InotifyCookie(ctx)
+	oldParent.notify(ctx, oldName, dirEv|linux.IN_MOVED_FROM, cookie, vfs.InodeEvent, false /* unlinked */)
+	newParent.notify(ctx, newName, dirEv|linux.IN_MOVED_TO, cookie, vfs.InodeEvent, false /* unlinked */)
+	// Somewhat surprisingly, self move events do not have a cookie.
+	renamed.notify(ctx, "", linux.IN_MOVE_SELF, 0, vfs.InodeEvent, false /* unlinked */)
+}
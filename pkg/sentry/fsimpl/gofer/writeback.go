@@ -0,0 +1,276 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Default write-back thresholds. defaultDirtyExpire is consistent with
+// Linux's default vm.dirty_expire_centisecs.
+const (
+	defaultDirtyBytes  = 64 << 20
+	defaultDirtyExpire = 30 * time.Second
+)
+
+// writeback writes dirty cached pages back to remote files in the
+// background, for filesystems using write-back caching
+// (filesystemOptions.writeback).
+//
+// Under write-back caching, writes to regular files are only written to the
+// page cache by the writing task. A dentry's dirty pages are then written
+// back once they have been dirty for filesystemOptions.dirtyExpire, or
+// earlier if the filesystem holds more than filesystemOptions.dirtyBytes of
+// dirty data, in which case the dentries that have been dirty the longest
+// are written back first. As in Linux, data that has been written but not
+// synced may be lost if the sandbox crashes, for at most dirtyExpire after
+// the write; fsync(2), fdatasync(2), msync(MS_SYNC) and closing the last
+// writable file description write back data synchronously, and files opened
+// with O_DIRECT, O_SYNC or O_DSYNC are not cached.
+type writeback struct {
+	fs *filesystem
+
+	// flushMu serializes writing back dentries with their destruction, so
+	// that dentries are never written back after dentry.destroyLocked().
+	flushMu sync.Mutex
+
+	// mu protects the following fields.
+	mu sync.Mutex
+
+	// dirty contains dentries that may have dirty cached pages.
+	dirty map[*dentry]*dirtyDentry
+
+	// dirtyBytes is the sum of dirtyDentry.bytes in dirty.
+	dirtyBytes uint64
+
+	// If paused is true, dentries are not written back; see
+	// writeback.pause().
+	paused bool
+
+	// kick is signaled to wake the writeback goroutine early. stopCh is
+	// closed to stop the writeback goroutine, which closes doneCh when it
+	// exits.
+	kick   chan struct{}
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// dirtyDentry is the value type of writeback.dirty.
+type dirtyDentry struct {
+	// dirtiedAt is the time at which the dentry was added to writeback.dirty.
+	dirtiedAt time.Time
+
+	// bytes is the number of bytes that have been written to the dentry's
+	// cached pages since dirtiedAt. Since pages may be rewritten, this may
+	// exceed the number of dirty bytes.
+	bytes uint64
+}
+
+// startWriteback starts writing back fs' dirty pages in the background.
+//
+// Preconditions: fs.opts.writeback.
+func (fs *filesystem) startWriteback() {
+	fs.wb = &writeback{
+		fs:     fs,
+		dirty:  make(map[*dentry]*dirtyDentry),
+		kick:   make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	go fs.wb.run() // S/R-SAFE: paused by filesystem.PrepareSave.
+}
+
+// markDirty records that n bytes of d's cached pages have been dirtied.
+func (wb *writeback) markDirty(d *dentry, n uint64) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	// The kernel must have resumed execution for d to be dirtied.
+	wb.paused = false
+	wb.markDirtyLocked(d, n)
+	if wb.dirtyBytes >= wb.fs.opts.dirtyBytes {
+		select {
+		case wb.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Preconditions: wb.mu must be locked.
+func (wb *writeback) markDirtyLocked(d *dentry, n uint64) {
+	dd, ok := wb.dirty[d]
+	if !ok {
+		dd = &dirtyDentry{dirtiedAt: time.Now()}
+		wb.dirty[d] = dd
+	}
+	dd.bytes += n
+	wb.dirtyBytes += n
+}
+
+// forget removes d from wb.dirty, after all of its dirty pages have been
+// written back by the caller.
+func (wb *writeback) forget(d *dentry) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	wb.forgetLocked(d)
+}
+
+// Preconditions: wb.mu must be locked.
+func (wb *writeback) forgetLocked(d *dentry) (*dirtyDentry, bool) {
+	dd, ok := wb.dirty[d]
+	if ok {
+		delete(wb.dirty, d)
+		wb.dirtyBytes -= dd.bytes
+	}
+	return dd, ok
+}
+
+// remove removes d from wb.dirty before d is destroyed, waiting for any
+// concurrent writeback of d to complete.
+func (wb *writeback) remove(d *dentry) {
+	wb.flushMu.Lock()
+	defer wb.flushMu.Unlock()
+	wb.forget(d)
+}
+
+// pause stops writeback until wb.markDirty() is next called, which can only
+// happen once the kernel has resumed execution. This prevents the writeback
+// goroutine from mutating dentries while they are being saved.
+func (wb *writeback) pause() {
+	wb.flushMu.Lock()
+	defer wb.flushMu.Unlock()
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	wb.paused = true
+}
+
+// stop stops the writeback goroutine and waits for it to exit.
+func (wb *writeback) stop() {
+	close(wb.stopCh)
+	<-wb.doneCh
+}
+
+// run is the writeback goroutine.
+func (wb *writeback) run() {
+	defer close(wb.doneCh)
+	ctx := context.Background()
+	expire := wb.fs.opts.dirtyExpire
+	timer := time.NewTimer(expire)
+	defer timer.Stop()
+	for {
+		select {
+		case <-wb.stopCh:
+			return
+		case <-wb.kick:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+		}
+		next := wb.writebackExpired(ctx)
+		if next <= 0 || next > expire {
+			next = expire
+		}
+		timer.Reset(next)
+	}
+}
+
+// writebackExpired writes back dentries that have been dirty for at least
+// the filesystem's dirty expiry time, and any others needed to reduce the
+// amount of dirty data below the filesystem's dirty byte limit. It returns
+// the time until the oldest remaining dentry expires, or 0 if there are no
+// remaining dirty dentries.
+func (wb *writeback) writebackExpired(ctx context.Context) time.Duration {
+	type candidate struct {
+		d         *dentry
+		dirtiedAt time.Time
+	}
+	wb.mu.Lock()
+	if wb.paused {
+		wb.mu.Unlock()
+		return 0
+	}
+	cands := make([]candidate, 0, len(wb.dirty))
+	for d, dd := range wb.dirty {
+		cands = append(cands, candidate{d, dd.dirtiedAt})
+	}
+	wb.mu.Unlock()
+	sort.Slice(cands, func(i, j int) bool {
+		return cands[i].dirtiedAt.Before(cands[j].dirtiedAt)
+	})
+
+	expire := wb.fs.opts.dirtyExpire
+	for _, c := range cands {
+		now := time.Now()
+		if age := now.Sub(c.dirtiedAt); age < expire {
+			wb.mu.Lock()
+			overLimit := wb.dirtyBytes >= wb.fs.opts.dirtyBytes
+			wb.mu.Unlock()
+			if !overLimit {
+				return expire - age
+			}
+		}
+		wb.writebackDentry(ctx, c.d)
+	}
+	return 0
+}
+
+// writebackDentry writes back all of d's dirty cached pages, if d is still in
+// wb.dirty.
+func (wb *writeback) writebackDentry(ctx context.Context, d *dentry) {
+	wb.flushMu.Lock()
+	defer wb.flushMu.Unlock()
+	wb.mu.Lock()
+	if wb.paused {
+		wb.mu.Unlock()
+		return
+	}
+	if _, ok := wb.forgetLocked(d); !ok {
+		wb.mu.Unlock()
+		return
+	}
+	wb.mu.Unlock()
+
+	d.handleMu.RLock()
+	h := d.writeHandleLocked()
+	d.dataMu.Lock()
+	var err error
+	if h.isOpen() {
+		err = fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt)
+	}
+	// Pages that are mapped writably remain dirty after writeback, as do
+	// pages that couldn't be written back. Write them back again later.
+	var remaining uint64
+	for seg := d.dirty.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		remaining += seg.Range().Length()
+	}
+	d.dataMu.Unlock()
+	d.handleMu.RUnlock()
+	if err != nil {
+		log.Warningf("gofer.writeback: failed to write back dirty data: %v", err)
+	}
+	if remaining != 0 {
+		// Don't wake the writeback goroutine, since these pages can't be
+		// cleaned by writing them back again immediately.
+		wb.mu.Lock()
+		wb.markDirtyLocked(d, remaining)
+		wb.mu.Unlock()
+	}
+}
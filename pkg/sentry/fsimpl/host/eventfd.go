@@ -0,0 +1,60 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package host
+
+import (
+	"strconv"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/eventfd"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// procSelfFD is a host FD for /proc/self/fd, used to identify anonymous host
+// files that can't be told apart by fstat(2). It is -1 if OpenProcSelfFD
+// hasn't been called.
+var procSelfFD = -1
+
+// OpenProcSelfFD opens /proc/self/fd for identifying imported host files. It
+// must be called before seccomp filters are installed, and the filters must
+// allow readlinkat(2) on the returned FD.
+func OpenProcSelfFD() (int, error) {
+	fd, err := unix.Open("/proc/self/fd", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	procSelfFD = fd
+	return fd, nil
+}
+
+// isEventFD returns true if hostFD is a host eventfd.
+func isEventFD(hostFD int) bool {
+	if procSelfFD < 0 {
+		return false
+	}
+	const target = "anon_inode:[eventfd]"
+	var buf [len(target) + 1]byte
+	n, err := unix.Readlinkat(procSelfFD, strconv.Itoa(hostFD), buf[:])
+	return err == nil && string(buf[:n]) == target
+}
+
+// newEventFD returns a file description operating directly on the host eventfd
+// hostFD.
+func newEventFD(ctx context.Context, mnt *vfs.Mount, hostFD int, flags uint32) (*vfs.FileDescription, error) {
+	// Constrain flags to the subset supported by eventfds.
+	flags &= unix.O_ACCMODE | unix.O_NONBLOCK
+	return eventfd.NewFromHost(ctx, mnt.Filesystem().VirtualFilesystem(), hostFD, flags)
+}
@@ -243,6 +243,11 @@ func NewFD(ctx context.Context, mnt *vfs.Mount, hostFD int, opts *NewFDOptions)
 	}
 
 	fileType := linux.FileMode(stat.Mode).FileType()
+	if fileType == 0 && isEventFD(hostFD) {
+		// Anonymous host files have no file type. Eventfds are operated on
+		// directly rather than through a host inode.
+		return newEventFD(ctx, mnt, hostFD, flags)
+	}
 	i, err := newInode(ctx, fs, hostFD, opts.Savable, fileType, opts.IsTTY)
 	if err != nil {
 		return nil, err
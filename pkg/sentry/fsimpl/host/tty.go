@@ -306,6 +306,28 @@ func (t *TTYFileDescription) Ioctl(ctx context.Context, io usermem.IO, args arch
 	}
 }
 
+// SetWinsize sets the window size of the host TTY on behalf of a process
+// outside of the sandbox, and sends SIGWINCH to the foreground process group.
+//
+// This corresponds to Linux drivers/tty/tty_io.c:tty_do_resize(). It is
+// needed because the foreground process group of a TTY that is not the
+// controlling terminal of any host process isn't notified of host resizes.
+// Unlike Linux, SIGWINCH is sent even if the size didn't change, since the
+// caller has typically already resized the host TTY through its master.
+func (t *TTYFileDescription) SetWinsize(ws *linux.Winsize) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := ioctlSetWinsize(t.inode.hostFD, ws); err != nil {
+		return err
+	}
+	if t.fgProcessGroup != nil {
+		// Linux ignores the result of kill_pgrp().
+		_ = t.fgProcessGroup.SendSignal(kernel.SignalInfoPriv(linux.SIGWINCH))
+	}
+	return nil
+}
+
 // checkChange checks that the process group is allowed to read, write, or
 // change the state of the TTY.
 //
@@ -17,6 +17,11 @@
 // Thus, user needs to set up IO_URING first with io_uring_setup(2) syscall and
 // then issue submission request using io_uring_enter(2).
 //
+// Submissions other than IORING_OP_NOP are executed on AIO goroutines (see
+// kernel.Task.QueueAIO), which post their completion queue entries when they
+// finish. As with AIO, operations that would block complete with EAGAIN
+// instead of waiting for the file to become ready.
+//
 // Another important note, as of now, we don't support deferred CQE. In other
 // words, the size of the backlogged set of CQE is zero. Whenever, completion
 // queue ring buffer is full, we drop the subsequent completion queue entries.
@@ -24,20 +29,32 @@ package iouringfs
 
 import (
 	"fmt"
+	"io"
 	"sync"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
-	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
+// Features is the set of IORING_FEAT_* flags describing the current IO_URING
+// implementation, as returned by io_uring_setup(2).
+//
+// IORING_FEAT_NODROP is not included, since completions are dropped when the
+// completion queue is full.
+const Features = linux.IORING_FEAT_SINGLE_MMAP | linux.IORING_FEAT_SUBMIT_STABLE | linux.IORING_FEAT_RW_CUR_POS
+
 // FileDescription implements vfs.FileDescriptionImpl for file-based IO_URING.
 // It is based on io_rings struct. See io_uring/io_uring.c.
 //
@@ -51,7 +68,24 @@ type FileDescription struct {
 	rbmf  ringsBufferFile
 	sqemf sqEntriesFile
 
-	// mu protects the fields below.
+	// sqOff and cqOff are the offsets of the fields of the submission and
+	// completion queues in the rings buffer, and sqEntries and cqEntries are
+	// the number of entries in each queue. They are immutable.
+	sqOff     linux.IOSqRingOffsets
+	cqOff     linux.IOCqRingOffsets
+	sqEntries uint32
+	cqEntries uint32
+
+	// mm is the MemoryManager charged for the memory backing the rings, and
+	// pinned is the number of bytes charged to it. Both are immutable.
+	mm     *mm.MemoryManager
+	pinned uint64
+
+	// queue is notified when entries are added to the completion queue.
+	queue waiter.Queue
+
+	// mu protects the fields below, and serializes updates to the fields of
+	// the rings that are owned by the kernel.
 	mu sync.Mutex `state:"nosave"`
 
 	ioRings *safemem.BlockSeq
@@ -94,7 +128,7 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 	if params.Flags&linux.IORING_SETUP_CQSIZE != 0 {
 		var ok bool
 		numCqEntries, ok = roundUpPowerOfTwo(params.CqEntries)
-		if !ok || numCqEntries < numSqEntries || numCqEntries > linux.IORING_SETUP_CQSIZE {
+		if !ok || numCqEntries < numSqEntries || numCqEntries > linux.IORING_MAX_CQ_ENTRIES {
 			return nil, linuxerr.EINVAL
 		}
 	} else {
@@ -119,6 +153,7 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 	sqEntriesSize = uint64(hostarch.Addr(sqEntriesSize).MustRoundUp())
 	sqefr, err := mfp.MemoryFile().Allocate(sqEntriesSize, pgalloc.AllocOpts{Kind: usage.Anonymous})
 	if err != nil {
+		mfp.MemoryFile().DecRef(rbfr)
 		return nil, linuxerr.ENOMEM
 	}
 
@@ -131,6 +166,8 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 			mf: mfp.MemoryFile(),
 			fr: sqefr,
 		},
+		sqEntries: numSqEntries,
+		cqEntries: numCqEntries,
 	}
 
 	// iouringfd is always set up with read/write mode.
@@ -165,8 +202,10 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 	params.CqOff = linux.PreComputedIOCqRingOffsets()
 	params.CqOff.Cqes = uint32(cqesOffset)
 
-	// Set features supported by the current IO_URING implementation.
-	params.Features = linux.IORING_FEAT_SINGLE_MMAP
+	iouringfd.sqOff = params.SqOff
+	iouringfd.cqOff = params.CqOff
+
+	params.Features = Features
 
 	if err := iouringfd.populateIORings(params); err != nil {
 		return nil, err
@@ -179,6 +218,16 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 		return nil, err
 	}
 
+	// Like Linux's io_uring/io_uring.c:io_account_mem(), charge the memory
+	// backing the rings to the creating task's address space.
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		if m := t.MemoryManager(); m != nil {
+			iouringfd.mm = m
+			iouringfd.pinned = ringsBufferSize + sqEntriesSize
+			m.IncPinnedMemory(iouringfd.pinned)
+		}
+	}
+
 	return &iouringfd.vfsfd, nil
 }
 
@@ -186,6 +235,38 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 func (fd *FileDescription) Release(context.Context) {
 	fd.rbmf.mf.DecRef(fd.rbmf.fr)
 	fd.sqemf.mf.DecRef(fd.sqemf.fr)
+	if fd.mm != nil {
+		fd.mm.DecPinnedMemory(fd.pinned)
+	}
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *FileDescription) Readiness(mask waiter.EventMask) waiter.EventMask {
+	// See io_uring/io_uring.c:io_uring_poll().
+	ready := waiter.EventMask(0)
+	if fd.numCompletions() > 0 {
+		ready |= waiter.ReadableEvents
+	}
+	if fd.numSubmissions() < fd.sqEntries {
+		ready |= waiter.WritableEvents
+	}
+	return mask & ready
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *FileDescription) EventRegister(e *waiter.Entry) error {
+	fd.queue.EventRegister(e)
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *FileDescription) EventUnregister(e *waiter.Entry) {
+	fd.queue.EventUnregister(e)
+}
+
+// Epollable implements FileDescriptionImpl.Epollable.
+func (fd *FileDescription) Epollable() bool {
+	return true
 }
 
 // unmarshalIORings handles unmarshalling IORings struct considering that there could be more than
@@ -212,6 +293,8 @@ func unmarshalIORings(ioRings *linux.IORings, bs *safemem.BlockSeq) error {
 func marshalIORings(ioRings *linux.IORings, bs *safemem.BlockSeq) error {
 	if bs.NumBlocks() == 1 && !bs.Head().NeedSafecopy() {
 		ioRings.MarshalBytes(bs.Head().TakeFirst((*linux.IORings)(nil).SizeBytes()).ToSlice())
+
+		return nil
 	}
 
 	buf := make([]byte, (*linux.IORings)(nil).SizeBytes())
@@ -226,16 +309,16 @@ func marshalIORings(ioRings *linux.IORings, bs *safemem.BlockSeq) error {
 
 // unmarshalSqe handles unmarshalling SQE struct considering that there could be more than one block
 // in the BlockSeq.
-func unmarshalSqe(sqe *linux.IOUringSqe, sqes *safemem.BlockSeq, sqHead uint32) error {
+func unmarshalSqe(sqe *linux.IOUringSqe, sqes *safemem.BlockSeq, index uint32) error {
 	sqeSize := uint32((*linux.IOUringSqe)(nil).SizeBytes())
 	if sqes.NumBlocks() == 1 && !sqes.Head().NeedSafecopy() {
-		sqe.UnmarshalBytes(sqes.Head().ToSlice()[sqHead*sqeSize : (sqHead+1)*sqeSize])
+		sqe.UnmarshalBytes(sqes.Head().ToSlice()[index*sqeSize : (index+1)*sqeSize])
 
 		return nil
 	}
 
-	buf := make([]byte, sqes.NumBytes())
-	cp, cperr := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf[sqHead*sqeSize:(sqHead+1)*sqeSize])), *sqes)
+	buf := make([]byte, sqeSize)
+	cp, cperr := safemem.CopySeq(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf)), sqes.DropFirst64(uint64(index*sqeSize)))
 	if cp == 0 {
 		return cperr
 	}
@@ -312,80 +395,295 @@ func (fd *FileDescription) ConfigureMMap(ctx context.Context, opts *memmap.MMapO
 	return vfs.GenericConfigureMMap(&fd.vfsfd, mf, opts)
 }
 
-// ProcessSubmissions processes submission requests.
-func (fd *FileDescription) ProcessSubmissions(toSubmit uint32, minComplete uint32, flags uint32) (int, error) {
+// loadRingUint32 atomically loads the uint32 at offset off in the rings
+// buffer. Since userspace updates the rings concurrently, their fields are
+// accessed individually rather than through IORings.
+func (fd *FileDescription) loadRingUint32(off uint32) (uint32, error) {
+	return safemem.LoadUint32(fd.ioRings.DropFirst64(uint64(off)).Head())
+}
+
+// storeRingUint32 atomically stores v at offset off in the rings buffer.
+func (fd *FileDescription) storeRingUint32(off, v uint32) error {
+	_, err := safemem.SwapUint32(fd.ioRings.DropFirst64(uint64(off)).Head(), v)
+	return err
+}
+
+// numSubmissions returns the number of SQEs in the submission queue.
+func (fd *FileDescription) numSubmissions() uint32 {
+	head, err := fd.loadRingUint32(fd.sqOff.Head)
+	if err != nil {
+		return 0
+	}
+	tail, err := fd.loadRingUint32(fd.sqOff.Tail)
+	if err != nil {
+		return 0
+	}
+	return tail - head
+}
+
+// numCompletions returns the number of CQEs in the completion queue.
+func (fd *FileDescription) numCompletions() uint32 {
+	head, err := fd.loadRingUint32(fd.cqOff.Head)
+	if err != nil {
+		return 0
+	}
+	tail, err := fd.loadRingUint32(fd.cqOff.Tail)
+	if err != nil {
+		return 0
+	}
+	return tail - head
+}
+
+// ProcessSubmissions processes up to toSubmit submission requests and returns
+// the number of requests consumed.
+func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32) (int, error) {
 	fd.mu.Lock()
 	defer fd.mu.Unlock()
 
-	var ioRings linux.IORings
-	err := fd.getIORings(&ioRings)
+	sqHead, err := fd.loadRingUint32(fd.sqOff.Head)
+	if err != nil {
+		return -1, err
+	}
+	sqTail, err := fd.loadRingUint32(fd.sqOff.Tail)
 	if err != nil {
 		return -1, err
 	}
-
-	sqes := fd.sqes
-	cqes := fd.cqes
 
 	var sqe linux.IOUringSqe
-	sqHead := atomicbitops.FromUint32(ioRings.Sq.Head)
-	sqTail := atomicbitops.FromUint32(ioRings.Sq.Tail)
-	cqHead := atomicbitops.FromUint32(ioRings.Cq.Head)
-	cqTail := atomicbitops.FromUint32(ioRings.Cq.Tail)
-
+	indexSize := uint32((*linux.IORingIndex)(nil).SizeBytes())
 	submitted := uint32(0)
-	for toSubmit > submitted {
-		sqHeadMasked := sqHead.Load() & ioRings.SqRingMask
-		cqTailMasked := cqTail.Load() & ioRings.CqRingMask
-		// This means that the submission queue is empty.
-		if sqHead == sqTail {
-			return int(submitted), nil
-		}
-
-		if err = unmarshalSqe(&sqe, sqes, sqHeadMasked); err != nil {
+	// sqHead == sqTail means that the submission queue is empty.
+	for toSubmit > submitted && sqHead != sqTail {
+		// The submission queue holds indexes into the array of SQEs. See
+		// io_uring/io_uring.c:io_get_sqe().
+		index, err := fd.loadRingUint32(fd.sqOff.Array + (sqHead&(fd.sqEntries-1))*indexSize)
+		if err != nil {
 			return -1, err
 		}
+		sqHead++
+		if index >= fd.sqEntries {
+			dropped, err := fd.loadRingUint32(fd.sqOff.Dropped)
+			if err != nil {
+				return -1, err
+			}
+			if err := fd.storeRingUint32(fd.sqOff.Dropped, dropped+1); err != nil {
+				return -1, err
+			}
+			break
+		}
 
-		cqe, err := fd.ProcessSubmission(&sqe, flags)
-		if err != nil {
+		if err = unmarshalSqe(&sqe, fd.sqes, index); err != nil {
 			return -1, err
 		}
-		sqHead.Add(1)
-		if (cqTail.Load()-cqHead.Load())/ioRings.CqRingEntries == 1 {
-			ioRings.CqOverflow++
-		} else {
-			if err = fd.updateCq(cqes, cqe, cqTailMasked); err != nil {
+
+		if cqe := fd.ProcessSubmission(t, &sqe); cqe != nil {
+			if err := fd.postCqeLocked(cqe); err != nil {
 				return -1, err
 			}
-			cqTail.Add(1)
 		}
 		submitted++
 	}
-	ioRings.Sq.Head = sqHead.Load()
-	ioRings.Cq.Tail = cqTail.Load()
 
-	if err = marshalIORings(&ioRings, fd.ioRings); err != nil {
+	if err := fd.storeRingUint32(fd.sqOff.Head, sqHead); err != nil {
 		return -1, err
 	}
 
 	return int(submitted), nil
 }
 
-// ProcessSubmission processes a single submission request.
-func (fd *FileDescription) ProcessSubmission(sqe *linux.IOUringSqe, flags uint32) (*linux.IOUringCqe, error) {
-	switch op := sqe.Opcode; op {
-	case 0: // NOP
-		return &linux.IOUringCqe{
-			UserData: sqe.UserData,
-			Res:      0,
-			Flags:    0,
-		}, nil
+// ioOperation performs the I/O requested by a submission on file, and returns
+// the number of bytes transferred.
+type ioOperation func(ctx context.Context, file *vfs.FileDescription) (int64, error)
+
+// IsSupportedOp returns true if IORING_OP_* opcode op is supported.
+func IsSupportedOp(op uint8) bool {
+	switch op {
+	case linux.IORING_OP_NOP, linux.IORING_OP_READV, linux.IORING_OP_WRITEV, linux.IORING_OP_FSYNC, linux.IORING_OP_READ, linux.IORING_OP_WRITE:
+		return true
+	default:
+		return false
+	}
+}
+
+// ProcessSubmission processes a single submission request. It returns the
+// completion queue entry for requests that complete immediately, or nil for
+// requests that have been queued and will post their completion queue entry
+// when they finish.
+func (fd *FileDescription) ProcessSubmission(t *kernel.Task, sqe *linux.IOUringSqe) *linux.IOUringCqe {
+	cqe := &linux.IOUringCqe{
+		UserData: sqe.UserData,
+	}
+
+	// Every operation other than NOP is executed asynchronously, so
+	// IOSQE_ASYNC has no effect. Fixed files, linked and drained requests,
+	// and buffer selection are not supported.
+	if sqe.Flags&^linux.IOSQE_ASYNC != 0 {
+		cqe.Res = errnoResult(linuxerr.EINVAL)
+		return cqe
+	}
+
+	var (
+		op  ioOperation
+		err error
+	)
+	switch sqe.Opcode {
+	case linux.IORING_OP_NOP:
+		return cqe
+	case linux.IORING_OP_READV, linux.IORING_OP_READ, linux.IORING_OP_WRITEV, linux.IORING_OP_WRITE:
+		op, err = readWriteOperation(t, sqe)
+	case linux.IORING_OP_FSYNC:
+		op, err = fsyncOperation(sqe)
 	default: // Unsupported operation
-		return &linux.IOUringCqe{
-			UserData: sqe.UserData,
-			Res:      -int32(linuxerr.EINVAL.Errno()),
-			Flags:    0,
+		err = linuxerr.EINVAL
+	}
+	if err != nil {
+		cqe.Res = errnoResult(err)
+		return cqe
+	}
+
+	file := t.GetFileVFS2(sqe.Fd)
+	if file == nil {
+		cqe.Res = errnoResult(linuxerr.EBADF)
+		return cqe
+	}
+	// Keep the rings alive until the completion has been posted.
+	fd.vfsfd.IncRef()
+	t.QueueAIO(func(ctx context.Context) {
+		n, err := op(ctx, file)
+		file.DecRef(ctx)
+		cqe.Res = completionResult(n, err)
+		fd.postCqe(cqe)
+		fd.vfsfd.DecRef(ctx)
+	})
+	return nil
+}
+
+// readWriteOperation returns the ioOperation for a READ, READV, WRITE or WRITEV
+// submission. The buffers are resolved at submission time, so the SQE and the
+// iovecs that it refers to may be reused as soon as io_uring_enter(2) returns
+// (IORING_FEAT_SUBMIT_STABLE).
+func readWriteOperation(t *kernel.Task, sqe *linux.IOUringSqe) (ioOperation, error) {
+	flags := sqe.SpecialFlags
+	if flags&^linux.RWF_VALID != 0 {
+		return nil, linuxerr.EOPNOTSUPP
+	}
+
+	addr := hostarch.Addr(sqe.AddrOrSpliceOff)
+	opts := usermem.IOOpts{
+		AddressSpaceActive: false, // AIO goroutines have no address space.
+	}
+	var (
+		ioseq usermem.IOSequence
+		err   error
+	)
+	switch sqe.Opcode {
+	case linux.IORING_OP_READ, linux.IORING_OP_WRITE:
+		ioseq, err = t.SingleIOSequence(addr, int(sqe.Len), opts)
+	default:
+		ioseq, err = t.IovecsIOSequence(addr, int(sqe.Len), opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// An offset of -1 selects the file's current position
+	// (IORING_FEAT_RW_CUR_POS). Like Linux, the offset is ignored for files
+	// that don't support positional I/O, such as pipes and sockets.
+	offset := int64(sqe.OffOrAddrOrCmdOp)
+	if sqe.Opcode == linux.IORING_OP_READ || sqe.Opcode == linux.IORING_OP_READV {
+		return func(ctx context.Context, file *vfs.FileDescription) (int64, error) {
+			opts := vfs.ReadOptions{Flags: flags}
+			if offset != -1 {
+				n, err := file.PRead(ctx, ioseq, offset, opts)
+				if !linuxerr.Equals(linuxerr.ESPIPE, err) {
+					return n, err
+				}
+			}
+			return file.Read(ctx, ioseq, opts)
 		}, nil
 	}
+	return func(ctx context.Context, file *vfs.FileDescription) (int64, error) {
+		opts := vfs.WriteOptions{Flags: flags}
+		if offset != -1 {
+			n, err := file.PWrite(ctx, ioseq, offset, opts)
+			if !linuxerr.Equals(linuxerr.ESPIPE, err) {
+				return n, err
+			}
+		}
+		return file.Write(ctx, ioseq, opts)
+	}, nil
+}
+
+// fsyncOperation returns the ioOperation for an FSYNC submission.
+func fsyncOperation(sqe *linux.IOUringSqe) (ioOperation, error) {
+	// See io_uring/sync.c:io_fsync_prep().
+	if sqe.AddrOrSpliceOff != 0 || sqe.SpecialFlags&^linux.IORING_FSYNC_DATASYNC != 0 {
+		return nil, linuxerr.EINVAL
+	}
+	// As for fdatasync(2), IORING_FSYNC_DATASYNC is implemented as a full
+	// sync.
+	return func(ctx context.Context, file *vfs.FileDescription) (int64, error) {
+		return 0, file.Sync(ctx)
+	}, nil
+}
+
+// completionResult returns the result to report in a CQE for an operation
+// that transferred n bytes and returned err.
+func completionResult(n int64, err error) int32 {
+	// As for read(2) and write(2), partial transfers are successful, and
+	// reaching EOF is not an error.
+	if n > 0 || err == nil || err == io.EOF {
+		return int32(n)
+	}
+	return errnoResult(err)
+}
+
+// errnoResult returns the result to report in a CQE for a failed operation.
+func errnoResult(err error) int32 {
+	return -int32(kernel.ExtractErrno(err, -1))
+}
+
+// postCqe is like postCqeLocked, but locks fd.mu.
+func (fd *FileDescription) postCqe(cqe *linux.IOUringCqe) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if err := fd.postCqeLocked(cqe); err != nil {
+		log.Warningf("Failed to post io_uring completion: %v", err)
+	}
+}
+
+// postCqeLocked adds cqe to the completion queue, or counts it in the overflow
+// counter if the completion queue is full.
+//
+// Preconditions: fd.mu is locked.
+func (fd *FileDescription) postCqeLocked(cqe *linux.IOUringCqe) error {
+	cqHead, err := fd.loadRingUint32(fd.cqOff.Head)
+	if err != nil {
+		return err
+	}
+	cqTail, err := fd.loadRingUint32(fd.cqOff.Tail)
+	if err != nil {
+		return err
+	}
+
+	if cqTail-cqHead >= fd.cqEntries {
+		overflow, err := fd.loadRingUint32(fd.cqOff.Overflow)
+		if err != nil {
+			return err
+		}
+		return fd.storeRingUint32(fd.cqOff.Overflow, overflow+1)
+	}
+
+	if err := fd.updateCq(fd.cqes, cqe, cqTail&(fd.cqEntries-1)); err != nil {
+		return err
+	}
+	// The tail must only be advanced once the CQE is visible.
+	if err := fd.storeRingUint32(fd.cqOff.Tail, cqTail+1); err != nil {
+		return err
+	}
+	fd.queue.Notify(waiter.ReadableEvents)
+
+	return nil
 }
 
 // updateCq updates a completion queue by adding a given completion queue entry.
@@ -397,7 +695,7 @@ func (fd *FileDescription) updateCq(cqes *safemem.BlockSeq, cqe *linux.IOUringCq
 		return nil
 	}
 
-	buf := make([]byte, cqes.NumBytes())
+	buf := make([]byte, cqeSize)
 	cqe.MarshalBytes(buf)
 	cp, cperr := safemem.CopySeq(cqes.DropFirst64(uint64(cqTail*cqeSize)), safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf)))
 	if cp == 0 {
@@ -407,10 +705,23 @@ func (fd *FileDescription) updateCq(cqes *safemem.BlockSeq, cqe *linux.IOUringCq
 	return nil
 }
 
-// getIORings unmarshalls IORings struct backed by the allocated memory.
-func (fd *FileDescription) getIORings(ioRings *linux.IORings) error {
-	if err := unmarshalIORings(ioRings, fd.ioRings); err != nil {
-		return err
+// WaitCompletions blocks until the completion queue holds at least
+// minComplete entries. See io_uring/io_uring.c:io_cqring_wait().
+func (fd *FileDescription) WaitCompletions(t *kernel.Task, minComplete uint32) error {
+	if minComplete > fd.cqEntries {
+		minComplete = fd.cqEntries
+	}
+	if fd.numCompletions() >= minComplete {
+		return nil
+	}
+
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	fd.queue.EventRegister(&e)
+	defer fd.queue.EventUnregister(&e)
+	for fd.numCompletions() < minComplete {
+		if err := t.Block(ch); err != nil {
+			return err
+		}
 	}
 
 	return nil
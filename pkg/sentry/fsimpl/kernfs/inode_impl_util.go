@@ -183,10 +183,11 @@ type InodeAttrs struct {
 	nlink     atomicbitops.Uint32
 	blockSize atomicbitops.Uint32
 
-	// Timestamps, all nsecs from the Unix epoch.
+	// Timestamps, all nsecs from the Unix epoch. btime is immutable.
 	atime atomicbitops.Int64
 	mtime atomicbitops.Int64
 	ctime atomicbitops.Int64
+	btime int64
 }
 
 // Init initializes this InodeAttrs.
@@ -211,6 +212,7 @@ func (a *InodeAttrs) Init(ctx context.Context, creds *auth.Credentials, devMajor
 	a.atime.Store(now)
 	a.mtime.Store(now)
 	a.ctime.Store(now)
+	a.btime = now
 }
 
 // DevMajor returns the device major number.
@@ -240,7 +242,7 @@ func (a *InodeAttrs) Links() uint32 {
 
 // TouchAtime updates a.atime to the current time.
 func (a *InodeAttrs) TouchAtime(ctx context.Context, mnt *vfs.Mount) {
-	if mnt.Flags.NoATime || mnt.ReadOnly() {
+	if mnt.Flags().NoATime || mnt.ReadOnly() {
 		return
 	}
 	if err := mnt.CheckBeginWrite(); err != nil {
@@ -264,7 +266,7 @@ func (a *InodeAttrs) TouchCMtime(ctx context.Context) {
 // with filesystem-specific fields.
 func (a *InodeAttrs) Stat(context.Context, *vfs.Filesystem, vfs.StatOptions) (linux.Statx, error) {
 	var stat linux.Statx
-	stat.Mask = linux.STATX_TYPE | linux.STATX_MODE | linux.STATX_UID | linux.STATX_GID | linux.STATX_INO | linux.STATX_NLINK | linux.STATX_ATIME | linux.STATX_MTIME | linux.STATX_CTIME
+	stat.Mask = linux.STATX_TYPE | linux.STATX_MODE | linux.STATX_UID | linux.STATX_GID | linux.STATX_INO | linux.STATX_NLINK | linux.STATX_ATIME | linux.STATX_MTIME | linux.STATX_CTIME | linux.STATX_BTIME
 	stat.DevMajor = a.devMajor
 	stat.DevMinor = a.devMinor
 	stat.Ino = a.ino.Load()
@@ -276,6 +278,7 @@ func (a *InodeAttrs) Stat(context.Context, *vfs.Filesystem, vfs.StatOptions) (li
 	stat.Atime = linux.NsecToStatxTimestamp(a.atime.Load())
 	stat.Mtime = linux.NsecToStatxTimestamp(a.mtime.Load())
 	stat.Ctime = linux.NsecToStatxTimestamp(a.ctime.Load())
+	stat.Btime = linux.NsecToStatxTimestamp(a.btime)
 	return stat, nil
 }
 
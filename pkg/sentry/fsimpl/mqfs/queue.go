@@ -69,6 +69,16 @@ type queueFD struct {
 	queue mq.View
 }
 
+// View returns the view into the message queue backing fd, or false if fd is
+// not a message queue file description.
+func View(fd *vfs.FileDescription) (mq.View, bool) {
+	qfd, ok := fd.Impl().(*queueFD)
+	if !ok {
+		return nil, false
+	}
+	return qfd.queue, true
+}
+
 // Init initializes a queueFD. Mostly copied from DynamicBytesFD.Init, but uses
 // the queueFD as FileDescriptionImpl.
 func (fd *queueFD) Init(m *vfs.Mount, d *kernfs.Dentry, data vfs.DynamicBytesSource, locks *vfs.FileLocks, flags uint32) error {
@@ -86,7 +86,7 @@ func NewRegistryImpl(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *
 }
 
 // Get implements mq.RegistryImpl.Get.
-func (r *RegistryImpl) Get(ctx context.Context, name string, access mq.AccessType, block bool, flags uint32) (*vfs.FileDescription, bool, error) {
+func (r *RegistryImpl) Get(ctx context.Context, name string, access mq.AccessType, flags uint32) (*vfs.FileDescription, bool, error) {
 	inode, err := r.root.Inode().(*rootInode).Lookup(ctx, name)
 	if err != nil {
 		return nil, false, nil
@@ -99,7 +99,7 @@ func (r *RegistryImpl) Get(ctx context.Context, name string, access mq.AccessTyp
 		return nil, false, linuxerr.EACCES
 	}
 
-	fd, err := r.newFD(qInode.queue, qInode, access, block, flags)
+	fd, err := r.newFD(qInode.queue, qInode, access, flags)
 	if err != nil {
 		return nil, false, err
 	}
@@ -107,14 +107,14 @@ func (r *RegistryImpl) Get(ctx context.Context, name string, access mq.AccessTyp
 }
 
 // New implements mq.RegistryImpl.New.
-func (r *RegistryImpl) New(ctx context.Context, name string, q *mq.Queue, access mq.AccessType, block bool, perm linux.FileMode, flags uint32) (*vfs.FileDescription, error) {
+func (r *RegistryImpl) New(ctx context.Context, name string, q *mq.Queue, access mq.AccessType, perm linux.FileMode, flags uint32) (*vfs.FileDescription, error) {
 	root := r.root.Inode().(*rootInode)
 	qInode := r.fs.newQueueInode(ctx, auth.CredentialsFromContext(ctx), q, perm).(*queueInode)
 	err := root.Insert(name, qInode)
 	if err != nil {
 		return nil, err
 	}
-	return r.newFD(q, qInode, access, block, flags)
+	return r.newFD(q, qInode, access, flags)
 }
 
 // Unlink implements mq.RegistryImpl.Unlink.
@@ -139,8 +139,8 @@ func (r *RegistryImpl) Destroy(ctx context.Context) {
 }
 
 // newFD returns a new file description created using the given queue and inode.
-func (r *RegistryImpl) newFD(q *mq.Queue, inode *queueInode, access mq.AccessType, block bool, flags uint32) (*vfs.FileDescription, error) {
-	view, err := mq.NewView(q, access, block)
+func (r *RegistryImpl) newFD(q *mq.Queue, inode *queueInode, access mq.AccessType, flags uint32) (*vfs.FileDescription, error) {
+	view, err := mq.NewView(q, access)
 	if err != nil {
 		return nil, err
 	}
@@ -16,6 +16,7 @@ package overlay
 
 import (
 	"fmt"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -396,6 +397,13 @@ func (d *dentry) copyXattrsLocked(ctx context.Context) error {
 		}
 
 		if err := vfsObj.SetXattrAt(ctx, d.fs.creds, upperPop, &vfs.SetXattrOptions{Name: name, Value: value}); err != nil {
+			// Attributes that the upper layer doesn't support are dropped,
+			// except for those in the security.* namespace (including file
+			// capabilities) that affect access to the file. See Linux's
+			// fs/overlayfs/copy_up.c:ovl_must_copy_xattr().
+			if linuxerr.Equals(linuxerr.EOPNOTSUPP, err) && !strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX) {
+				continue
+			}
 			ctx.Infof("failed to copy up xattrs because SetXattrAt failed: %v", err)
 			return err
 		}
@@ -265,6 +265,26 @@ func (fd *regularFileFD) Epollable() bool {
 	return wrappedFD.Epollable()
 }
 
+// CacheStat implements vfs.FileDescriptionImplCacheStatExtension.CacheStat.
+func (fd *regularFileFD) CacheStat(ctx context.Context, mr memmap.MappableRange) (memmap.CacheStat, error) {
+	wrappedFD, err := fd.getCurrentFD(ctx)
+	if err != nil {
+		return memmap.CacheStat{}, err
+	}
+	defer wrappedFD.DecRef(ctx)
+	return wrappedFD.CacheStat(ctx, mr)
+}
+
+// Fadvise implements vfs.FileDescriptionImplFadviseExtension.Fadvise.
+func (fd *regularFileFD) Fadvise(ctx context.Context, offset, length int64, advice int32) error {
+	wrappedFD, err := fd.getCurrentFD(ctx)
+	if err != nil {
+		return err
+	}
+	defer wrappedFD.DecRef(ctx)
+	return wrappedFD.Fadvise(ctx, offset, length, advice)
+}
+
 // PRead implements vfs.FileDescriptionImpl.PRead.
 func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
 	wrappedFD, err := fd.getCurrentFD(ctx)
@@ -478,3 +498,26 @@ func (d *dentry) InvalidateUnsavable(ctx context.Context) error {
 	defer d.mapsMu.Unlock()
 	return d.wrappedMappable.InvalidateUnsavable(ctx)
 }
+
+// CacheStat implements memmap.CachedMappable.CacheStat.
+func (d *dentry) CacheStat(mr memmap.MappableRange) memmap.CacheStat {
+	d.dataMu.RLock()
+	defer d.dataMu.RUnlock()
+	if cm, ok := d.wrappedMappable.(memmap.CachedMappable); ok {
+		return cm.CacheStat(mr)
+	}
+	return memmap.CacheStat{Cache: mr.Length() / hostarch.PageSize}
+}
+
+// CachedRanges implements memmap.CachedMappable.CachedRanges.
+func (d *dentry) CachedRanges(mr memmap.MappableRange, fn func(memmap.MappableRange)) {
+	d.dataMu.RLock()
+	defer d.dataMu.RUnlock()
+	if cm, ok := d.wrappedMappable.(memmap.CachedMappable); ok {
+		cm.CachedRanges(mr, fn)
+		return
+	}
+	// Consistently with mincore(2) on other Mappables, report everything as
+	// cached.
+	fn(mr)
+}
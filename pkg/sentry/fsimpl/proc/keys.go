@@ -0,0 +1,161 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// keysData implements vfs.DynamicBytesSource for /proc/keys.
+//
+// +stateify savable
+type keysData struct {
+	dynamicBytesFileSetAttr
+}
+
+var _ dynamicInode = (*keysData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*keysData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		// Keys are only visible to tasks.
+		return nil
+	}
+	// Unreachable keys are collected lazily, so collect them first to avoid
+	// listing them.
+	t.Kernel().CollectKeys()
+	// Compare Linux's security/keys/proc.c:proc_keys_show().
+	t.Keys().ForEachVisible(t.KeyRequester(), func(info auth.KeyInfo) {
+		revoked := byte('-')
+		if info.Revoked {
+			revoked = 'R'
+		}
+		fmt.Fprintf(buf, "%08x I%c-Q--- %5d %4s %08x %5d %5d %-9.9s %s", uint32(info.Serial), revoked, info.Usage, "perm", uint32(info.Perm), info.UID, info.GID, info.Type, info.Description)
+		switch {
+		case info.Type == auth.KeyTypeUser && !info.Revoked:
+			fmt.Fprintf(buf, ": %d", info.Length)
+		case info.Type == auth.KeyTypeKeyring && info.Length == 0:
+			buf.WriteString(": empty")
+		case info.Type == auth.KeyTypeKeyring:
+			fmt.Fprintf(buf, ": %d", info.Length)
+		}
+		buf.WriteString("\n")
+	})
+	return nil
+}
+
+// keyLimit identifies a field of auth.KeyLimits.
+type keyLimit int
+
+const (
+	keyLimitMaxKeys keyLimit = iota
+	keyLimitMaxBytes
+	keyLimitRootMaxKeys
+	keyLimitRootMaxBytes
+)
+
+// field returns a pointer to the field of limits identified by l.
+func (l keyLimit) field(limits *auth.KeyLimits) *uint32 {
+	switch l {
+	case keyLimitMaxKeys:
+		return &limits.MaxKeys
+	case keyLimitMaxBytes:
+		return &limits.MaxBytes
+	case keyLimitRootMaxKeys:
+		return &limits.RootMaxKeys
+	case keyLimitRootMaxBytes:
+		return &limits.RootMaxBytes
+	default:
+		panic(fmt.Sprintf("unknown key limit %d", l))
+	}
+}
+
+// keyLimitData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/kernel/keys/{maxkeys,maxbytes,root_maxkeys,root_maxbytes}.
+//
+// +stateify savable
+type keyLimitData struct {
+	kernfs.DynamicBytesFile
+
+	keys  *auth.KeySet
+	limit keyLimit
+}
+
+var _ vfs.WritableDynamicBytesSource = (*keyLimitData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *keyLimitData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	limits := d.keys.Limits()
+	_, err := fmt.Fprintf(buf, "%d\n", *d.limit.field(&limits))
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *keyLimitData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	// Linux's security/keys/sysctl.c bounds the limits to [1, INT_MAX].
+	if v < 1 {
+		return 0, linuxerr.EINVAL
+	}
+
+	// The limits are changed one at a time, so a racing write to another
+	// limit may be lost; Linux has the same race.
+	limits := d.keys.Limits()
+	*d.limit.field(&limits) = uint32(v)
+	d.keys.SetLimits(limits)
+	return n, nil
+}
+
+// newKeysSysDir returns the /proc/sys/kernel/keys directory.
+func (fs *filesystem) newKeysSysDir(ctx context.Context, root *auth.Credentials, k *kernel.Kernel) kernfs.Inode {
+	keys := k.RootUserNamespace().Keys()
+	limitFile := func(limit keyLimit) kernfs.Inode {
+		return fs.newInode(ctx, root, 0644, &keyLimitData{keys: keys, limit: limit})
+	}
+	return fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+		"gc_delay":                  fs.newInode(ctx, root, 0444, newStaticFile("300\n")),
+		"maxbytes":                  limitFile(keyLimitMaxBytes),
+		"maxkeys":                   limitFile(keyLimitMaxKeys),
+		"persistent_keyring_expiry": fs.newInode(ctx, root, 0444, newStaticFile("259200\n")),
+		"root_maxbytes":             limitFile(keyLimitRootMaxBytes),
+		"root_maxkeys":              limitFile(keyLimitRootMaxKeys),
+	})
+}
@@ -18,6 +18,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -568,6 +571,26 @@ func (d *smapsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// smapsRollupData implements vfs.DynamicBytesSource for
+// /proc/[pid]/smaps_rollup.
+//
+// +stateify savable
+type smapsRollupData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*smapsRollupData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *smapsRollupData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if mm := getMM(d.task); mm != nil {
+		mm.ReadSmapsRollupDataInto(ctx, buf)
+	}
+	return nil
+}
+
 // +stateify savable
 type taskStatData struct {
 	kernfs.DynamicBytesFile
@@ -667,6 +690,69 @@ func (s *statmData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// limitsData implements vfs.DynamicBytesSource for /proc/[pid]/limits.
+//
+// +stateify savable
+type limitsData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*limitsData)(nil)
+
+// limitNames are the names and units of each limits.LimitType. See Linux's
+// fs/proc/base.c:lnames.
+var limitNames = []struct {
+	name string
+	unit string
+}{
+	limits.CPU:               {"Max cpu time", "seconds"},
+	limits.FileSize:          {"Max file size", "bytes"},
+	limits.Data:              {"Max data size", "bytes"},
+	limits.Stack:             {"Max stack size", "bytes"},
+	limits.Core:              {"Max core file size", "bytes"},
+	limits.Rss:               {"Max resident set", "bytes"},
+	limits.ProcessCount:      {"Max processes", "processes"},
+	limits.NumberOfFiles:     {"Max open files", "files"},
+	limits.MemoryLocked:      {"Max locked memory", "bytes"},
+	limits.AS:                {"Max address space", "bytes"},
+	limits.Locks:             {"Max file locks", "locks"},
+	limits.SignalsPending:    {"Max pending signals", "signals"},
+	limits.MessageQueueBytes: {"Max msgqueue size", "bytes"},
+	limits.Nice:              {"Max nice priority", ""},
+	limits.RealTimePriority:  {"Max realtime priority", ""},
+	limits.Rttime:            {"Max realtime timeout", "us"},
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *limitsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	tg := d.task.ThreadGroup()
+	if tg == nil {
+		// The task has exited.
+		return linuxerr.ESRCH
+	}
+	ls := tg.Limits()
+
+	formatLimit := func(v uint64) string {
+		if v == limits.Infinity {
+			return "unlimited"
+		}
+		return strconv.FormatUint(v, 10)
+	}
+
+	fmt.Fprintf(buf, "%-25s %-20s %-20s %-10s\n", "Limit", "Soft Limit", "Hard Limit", "Units")
+	for lt, n := range limitNames {
+		lim := ls.Get(limits.LimitType(lt))
+		fmt.Fprintf(buf, "%-25s %-20s %-20s ", n.name, formatLimit(lim.Cur), formatLimit(lim.Max))
+		if n.unit != "" {
+			fmt.Fprintf(buf, "%-10s", n.unit)
+		}
+		buf.WriteString("\n")
+	}
+	return nil
+}
+
 // statusInode implements kernfs.Inode for /proc/[pid]/status.
 //
 // +stateify savable
@@ -782,7 +868,7 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	egid := creds.EffectiveKGID.In(s.userns).OrOverflow()
 	sgid := creds.SavedKGID.In(s.userns).OrOverflow()
 	var fds int
-	var vss, rss, data uint64
+	var vss, pinned, rss, data, swap uint64
 	s.task.WithMuLocked(func(t *kernel.Task) {
 		if fdTable := t.FDTable(); fdTable != nil {
 			fds = fdTable.CurrentMaxFDs()
@@ -790,8 +876,10 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	})
 	if mm := getMM(s.task); mm != nil {
 		vss = mm.VirtualMemorySize()
+		pinned = mm.PinnedMemorySize()
 		rss = mm.ResidentSetSize()
 		data = mm.VirtualDataSize()
+		swap = mm.SwapSize()
 	}
 	// Filesystem user/group IDs aren't implemented; effective UID/GID are used
 	// instead.
@@ -809,8 +897,10 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	buf.WriteString(" \n")
 
 	fmt.Fprintf(buf, "VmSize:\t%d kB\n", vss>>10)
+	fmt.Fprintf(buf, "VmPin:\t%d kB\n", pinned>>10)
 	fmt.Fprintf(buf, "VmRSS:\t%d kB\n", rss>>10)
 	fmt.Fprintf(buf, "VmData:\t%d kB\n", data>>10)
+	fmt.Fprintf(buf, "VmSwap:\t%d kB\n", swap>>10)
 
 	fmt.Fprintf(buf, "Threads:\t%d\n", s.task.ThreadGroup().Count())
 	fmt.Fprintf(buf, "CapInh:\t%016x\n", creds.InheritableCaps)
@@ -818,10 +908,15 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "CapEff:\t%016x\n", creds.EffectiveCaps)
 	fmt.Fprintf(buf, "CapBnd:\t%016x\n", creds.BoundingCaps)
 	fmt.Fprintf(buf, "Seccomp:\t%d\n", s.task.SeccompMode())
-	// We unconditionally report a single NUMA node. See
+	// All NUMA nodes presented by the MemoryFile are allowed. See
 	// pkg/sentry/syscalls/linux/sys_mempolicy.go.
-	fmt.Fprintf(buf, "Mems_allowed:\t1\n")
-	fmt.Fprintf(buf, "Mems_allowed_list:\t0\n")
+	if nodes := s.task.Kernel().NUMANodes(); nodes > 1 {
+		fmt.Fprintf(buf, "Mems_allowed:\t%x\n", uint64(1)<<nodes-1)
+		fmt.Fprintf(buf, "Mems_allowed_list:\t0-%d\n", nodes-1)
+	} else {
+		fmt.Fprintf(buf, "Mems_allowed:\t1\n")
+		fmt.Fprintf(buf, "Mems_allowed_list:\t0\n")
+	}
 	return nil
 }
 
@@ -900,6 +995,149 @@ func (o *oomScoreAdj) Write(ctx context.Context, _ *vfs.FileDescription, src use
 	return n, nil
 }
 
+// coredumpFilter implements vfs.WritableDynamicBytesSource for
+// /proc/[pid]/coredump_filter.
+//
+// +stateify savable
+type coredumpFilter struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ vfs.WritableDynamicBytesSource = (*coredumpFilter)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (c *coredumpFilter) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	m, err := getMMIncRef(c.task)
+	if err != nil {
+		return linuxerr.ESRCH
+	}
+	defer m.DecUsers(ctx)
+	fmt.Fprintf(buf, "%08x\n", m.CoreDumpFilter())
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (c *coredumpFilter) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit input size so as not to impact performance if input size is large.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+	b := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Compare Linux's fs/proc/base.c:proc_coredump_filter_write().
+	v, err := strconv.ParseUint(strings.TrimSpace(string(b[:n])), 0, 32)
+	if err != nil {
+		return 0, linuxerr.EINVAL
+	}
+	m, err := getMMIncRef(c.task)
+	if err != nil {
+		return 0, linuxerr.ESRCH
+	}
+	defer m.DecUsers(ctx)
+	m.SetCoreDumpFilter(uint32(v))
+	return int64(n), nil
+}
+
+// timensOffsets implements vfs.WritableDynamicBytesSource for
+// /proc/[pid]/timens_offsets, which holds the clock offsets of the time
+// namespace that the task's children will enter.
+//
+// +stateify savable
+type timensOffsets struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ vfs.WritableDynamicBytesSource = (*timensOffsets)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (o *timensOffsets) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if o.task.ExitState() == kernel.TaskExitDead {
+		return linuxerr.ESRCH
+	}
+	monotonic, boottime := o.task.TimeNamespaceForChildren().Offsets()
+	// Compare Linux's kernel/time/namespace.c:proc_timens_show_offsets().
+	for _, c := range []struct {
+		name   string
+		offset int64
+	}{
+		{"monotonic", monotonic.Nanoseconds()},
+		{"boottime", boottime.Nanoseconds()},
+	} {
+		ts := linux.NsecToTimespec(c.offset)
+		fmt.Fprintf(buf, "%-10s %10d %9d\n", c.name, ts.Sec, ts.Nsec)
+	}
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (o *timensOffsets) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit input size so as not to impact performance if input size is large.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+	b := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, b)
+	if err != nil {
+		return 0, err
+	}
+
+	if o.task.ExitState() == kernel.TaskExitDead {
+		return 0, linuxerr.ESRCH
+	}
+	ns := o.task.TimeNamespaceForChildren()
+	monotonic, boottime := ns.Offsets()
+
+	// Each line is "<clock> <seconds> <nanoseconds>", where <clock> is a
+	// clock ID or name. Offsets that aren't given are left unchanged. Compare
+	// Linux's fs/proc/base.c:timens_offsets_write().
+	lines := strings.Split(strings.TrimSuffix(string(b[:n]), "\n"), "\n")
+	if len(lines) > 2 {
+		return 0, linuxerr.EINVAL
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return 0, linuxerr.EINVAL
+		}
+		sec, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, linuxerr.EINVAL
+		}
+		nsec, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil || nsec >= 1e9 {
+			return 0, linuxerr.EINVAL
+		}
+		if sec > linux.KTIME_SEC_MAX || sec < -linux.KTIME_SEC_MAX {
+			return 0, linuxerr.ERANGE
+		}
+		off := time.Duration(sec)*time.Second + time.Duration(nsec)
+		switch fields[0] {
+		case "monotonic", strconv.Itoa(linux.CLOCK_MONOTONIC):
+			monotonic = off
+		case "boottime", strconv.Itoa(linux.CLOCK_BOOTTIME):
+			boottime = off
+		default:
+			return 0, linuxerr.EINVAL
+		}
+	}
+	if err := ns.SetOffsets(auth.CredentialsFromContext(ctx), monotonic, boottime); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
 // exeSymlink is an symlink for the /proc/[pid]/exe file.
 //
 // +stateify savable
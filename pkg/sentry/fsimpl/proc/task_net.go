@@ -31,10 +31,14 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
 	"gvisor.dev/gvisor/pkg/sentry/socket/unix"
 	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	tcpipstack "gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
 )
 
 func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kernfs.Inode {
@@ -50,7 +54,6 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 			packet    = "sk       RefCnt Type Proto  Iface R Rmem   User   Inode\n"
 			protocols = "protocol  size sockets  memory press maxhdr  slab module     cl co di ac io in de sh ss gs se re sp bi br ha uh gp em\n"
 			ptype     = "Type Device      Function\n"
-			upd6      = "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
 		)
 		psched := fmt.Sprintf("%08x %08x %08x %08x\n", uint64(time.Microsecond/time.Nanosecond), 64, 1000000, uint64(time.Second/time.Nanosecond))
 
@@ -74,7 +77,8 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 			"psched": fs.newInode(ctx, root, 0444, newStaticFile(psched)),
 			"ptype":  fs.newInode(ctx, root, 0444, newStaticFile(ptype)),
 			"route":  fs.newInode(ctx, root, 0444, &netRouteData{stack: stack}),
-			"tcp":    fs.newInode(ctx, root, 0444, &netTCPData{kernel: k}),
+			"raw":    fs.newInode(ctx, root, 0444, &netRawData{kernel: k}),
+			"tcp":    fs.newInode(ctx, root, 0444, &netTCPData{kernel: k, stack: stack}),
 			"udp":    fs.newInode(ctx, root, 0444, &netUDPData{kernel: k}),
 			"unix":   fs.newInode(ctx, root, 0444, &netUnixData{kernel: k}),
 		}
@@ -82,8 +86,9 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 		if stack.SupportsIPv6() {
 			contents["if_inet6"] = fs.newInode(ctx, root, 0444, &ifinet6{stack: stack})
 			contents["ipv6_route"] = fs.newInode(ctx, root, 0444, newStaticFile(""))
-			contents["tcp6"] = fs.newInode(ctx, root, 0444, &netTCP6Data{kernel: k})
-			contents["udp6"] = fs.newInode(ctx, root, 0444, newStaticFile(upd6))
+			contents["raw6"] = fs.newInode(ctx, root, 0444, &netRaw6Data{kernel: k})
+			contents["tcp6"] = fs.newInode(ctx, root, 0444, &netTCP6Data{kernel: k, stack: stack})
+			contents["udp6"] = fs.newInode(ctx, root, 0444, &netUDP6Data{kernel: k})
 		}
 	}
 
@@ -344,12 +349,65 @@ func writeInetAddr(w io.Writer, family int, i linux.SockAddr) {
 	}
 }
 
-func commonGenerateTCP(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel, family int) error {
+// socketOwner returns the uid and inode number of socket file s, as reported
+// in /proc/net/{tcp,udp,raw}{,6}.
+func socketOwner(ctx context.Context, s *vfs.FileDescription) (uid uint32, ino uint64) {
+	stat, err := s.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_UID | linux.STATX_INO})
+	if err != nil || stat.Mask&linux.STATX_UID == 0 {
+		log.Warningf("Failed to retrieve uid for socket file: %v", err)
+	} else {
+		creds := auth.CredentialsFromContext(ctx)
+		uid = uint32(auth.KUID(stat.UID).In(creds.UserNamespace).OrOverflow())
+	}
+	if err != nil || stat.Mask&linux.STATX_INO == 0 {
+		log.Warningf("Failed to retrieve inode for socket file: %v", err)
+	} else {
+		ino = stat.Ino
+	}
+	return uid, ino
+}
+
+// netstackEndpoint returns the netstack endpoint of socket s, or nil if s isn't
+// a netstack socket.
+func netstackEndpoint(s socket.SocketVFS2) tcpip.Endpoint {
+	if ns, ok := s.(*netstack.SocketVFS2); ok {
+		return ns.Endpoint
+	}
+	return nil
+}
+
+// inetEntry is an entry in /proc/net/{tcp,udp,raw}{,6}.
+type inetEntry struct {
+	// sl is the entry number.
+	sl int64
+
+	local, remote linux.SockAddr
+	state         uint32
+
+	// ep is the netstack endpoint of the entry, or nil if it doesn't have
+	// one.
+	ep tcpip.Endpoint
+
+	// uid and ino are the owner and inode number of the socket file, which
+	// are 0 for endpoints without one.
+	uid uint32
+	ino uint64
+
+	// refs is the reference count on the socket file.
+	refs int64
+}
+
+// listInetSockets returns an entry for each socket of the given family and
+// type in k for which match returns true, and the set of their netstack
+// endpoints.
+func listInetSockets(ctx context.Context, k *kernel.Kernel, family int, match func(stype linux.SockType, protocol int) bool) ([]inetEntry, map[tcpip.Endpoint]struct{}) {
 	// t may be nil here if our caller is not part of a task goroutine. This can
 	// happen for example if we're here for "sentryctl cat". When t is nil,
 	// degrade gracefully and retrieve what we can.
 	t := kernel.TaskFromContext(ctx)
 
+	var entries []inetEntry
+	owned := make(map[tcpip.Endpoint]struct{})
 	for _, se := range k.ListSockets() {
 		s := se.SockVFS2
 		if !s.TryIncRef() {
@@ -360,104 +418,173 @@ func commonGenerateTCP(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel,
 		if !ok {
 			panic(fmt.Sprintf("Found non-socket file in socket table: %+v", s))
 		}
-		if fa, stype, _ := sops.Type(); !(family == fa && stype == linux.SOCK_STREAM) {
+		if fa, stype, protocol := sops.Type(); fa != family || !match(stype, protocol) {
 			s.DecRef(ctx)
-			// Not tcp4 sockets.
 			continue
 		}
 
+		e := inetEntry{
+			sl:    int64(se.ID),
+			state: sops.State(),
+			ep:    netstackEndpoint(sops),
+			// Don't count the ref we obtain while deferencing the weakref
+			// to this socket.
+			refs: s.ReadRefs() - 1,
+		}
+		if e.ep != nil {
+			owned[e.ep] = struct{}{}
+		}
+		if t != nil {
+			if local, _, err := sops.GetSockName(t); err == nil {
+				e.local = local
+			}
+			if remote, _, err := sops.GetPeerName(t); err == nil {
+				e.remote = remote
+			}
+		}
+		e.uid, e.ino = socketOwner(ctx, s)
+		entries = append(entries, e)
+
+		s.DecRef(ctx)
+	}
+	return entries, owned
+}
+
+// listUnownedTCPEndpoints returns an entry for each TCP endpoint of the given
+// family in stack that isn't in owned, i.e. that has no socket file. These are
+// connections that are still closing, e.g. in TIME-WAIT, after their socket
+// was closed, and connections in SYN-RECV or waiting to be accepted by a
+// listening socket. Entries are numbered from sl.
+func listUnownedTCPEndpoints(stack inet.Stack, family int, owned map[tcpip.Endpoint]struct{}, sl int64) []inetEntry {
+	if stack == nil {
+		return nil
+	}
+	netProto := header.IPv4ProtocolNumber
+	if family == linux.AF_INET6 {
+		netProto = header.IPv6ProtocolNumber
+	}
+	var entries []inetEntry
+	for _, te := range stack.RegisteredEndpoints() {
+		ep, ok := te.(tcpip.Endpoint)
+		if !ok {
+			continue
+		}
+		if _, ok := owned[ep]; ok {
+			continue
+		}
+		// Endpoints are registered once for each network protocol that
+		// they're bound to.
+		owned[ep] = struct{}{}
+		info, ok := ep.Info().(*tcpipstack.TransportEndpointInfo)
+		if !ok || info.TransProto != header.TCPProtocolNumber || info.NetProto != netProto {
+			continue
+		}
+		local, _ := socket.ConvertAddress(family, tcpip.FullAddress{Addr: info.ID.LocalAddress, Port: info.ID.LocalPort})
+		remote, _ := socket.ConvertAddress(family, tcpip.FullAddress{Addr: info.ID.RemoteAddress, Port: info.ID.RemotePort})
+		entries = append(entries, inetEntry{
+			sl:     sl,
+			local:  local,
+			remote: remote,
+			state:  netstack.LinuxTCPState(tcp.EndpointState(ep.State())),
+			ep:     ep,
+		})
+		sl++
+	}
+	return entries
+}
+
+func commonGenerateTCP(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel, stack inet.Stack, family int) error {
+	entries, owned := listInetSockets(ctx, k, family, func(stype linux.SockType, protocol int) bool {
+		return stype == linux.SOCK_STREAM && (protocol == 0 || protocol == linux.IPPROTO_TCP)
+	})
+	var sl int64
+	for _, e := range entries {
+		if e.sl >= sl {
+			sl = e.sl + 1
+		}
+	}
+	entries = append(entries, listUnownedTCPEndpoints(stack, family, owned, sl)...)
+
+	for _, e := range entries {
 		// Linux's documentation for the fields below can be found at
 		// https://www.kernel.org/doc/Documentation/networking/proc_net_tcp.txt.
 		// For Linux's implementation, see net/ipv4/tcp_ipv4.c:get_tcp4_sock().
 		// Note that the header doesn't contain labels for all the fields.
+		var (
+			status tcpip.TCPStatusOption
+			info   tcpip.TCPInfoOption
+		)
+		if e.ep != nil {
+			e.ep.GetSockOpt(&status)
+			e.ep.GetSockOpt(&info)
+		}
 
 		// Field: sl; entry number.
-		fmt.Fprintf(buf, "%4d: ", se.ID)
+		fmt.Fprintf(buf, "%4d: ", e.sl)
 
 		// Field: local_adddress.
-		var localAddr linux.SockAddr
-		if t != nil {
-			if local, _, err := sops.GetSockName(t); err == nil {
-				localAddr = local
-			}
-		}
-		writeInetAddr(buf, family, localAddr)
+		writeInetAddr(buf, family, e.local)
 
 		// Field: rem_address.
-		var remoteAddr linux.SockAddr
-		if t != nil {
-			if remote, _, err := sops.GetPeerName(t); err == nil {
-				remoteAddr = remote
-			}
-		}
-		writeInetAddr(buf, family, remoteAddr)
+		writeInetAddr(buf, family, e.remote)
 
 		// Field: state; socket state.
-		fmt.Fprintf(buf, "%02X ", sops.State())
+		fmt.Fprintf(buf, "%02X ", e.state)
 
-		// Field: tx_queue, rx_queue; number of packets in the transmit and
-		// receive queue. Unimplemented.
-		fmt.Fprintf(buf, "%08X:%08X ", 0, 0)
+		// Field: tx_queue, rx_queue; number of bytes in the transmit and
+		// receive queue. For listening sockets, the backlog and the number
+		// of connections waiting to be accepted.
+		fmt.Fprintf(buf, "%08X:%08X ", status.SendQueue, status.ReceiveQueue)
 
-		// Field: tr, tm->when; timer active state and number of jiffies
-		// until timer expires. Unimplemented.
-		fmt.Fprintf(buf, "%02X:%08X ", 0, 0)
+		// Field: tr, tm->when; timer active state and number of clock ticks
+		// until timer expires.
+		fmt.Fprintf(buf, "%02X:%08X ", status.Timer, linux.ClockTFromDuration(status.TimerExpires))
 
 		// Field: retrnsmt; number of unrecovered RTO timeouts.
-		// Unimplemented.
-		fmt.Fprintf(buf, "%08X ", 0)
-
-		stat, statErr := s.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_UID | linux.STATX_INO})
+		fmt.Fprintf(buf, "%08X ", info.Retransmits)
 
 		// Field: uid.
-		if statErr != nil || stat.Mask&linux.STATX_UID == 0 {
-			log.Warningf("Failed to retrieve uid for socket file: %v", statErr)
-			fmt.Fprintf(buf, "%5d ", 0)
-		} else {
-			creds := auth.CredentialsFromContext(ctx)
-			fmt.Fprintf(buf, "%5d ", uint32(auth.KUID(stat.UID).In(creds.UserNamespace).OrOverflow()))
-		}
+		fmt.Fprintf(buf, "%5d ", e.uid)
 
 		// Field: timeout; number of unanswered 0-window probes.
-		// Unimplemented.
-		fmt.Fprintf(buf, "%8d ", 0)
+		fmt.Fprintf(buf, "%8d ", status.ZeroWindowProbes)
 
 		// Field: inode.
-		if statErr != nil || stat.Mask&linux.STATX_INO == 0 {
-			log.Warningf("Failed to retrieve inode for socket file: %v", statErr)
-			fmt.Fprintf(buf, "%8d ", 0)
-		} else {
-			fmt.Fprintf(buf, "%8d ", stat.Ino)
-		}
+		fmt.Fprintf(buf, "%8d ", e.ino)
 
-		// Field: refcount. Don't count the ref we obtain while deferencing
-		// the weakref to this socket.
-		fmt.Fprintf(buf, "%d ", s.ReadRefs()-1)
+		// Field: refcount.
+		fmt.Fprintf(buf, "%d ", e.refs)
 
 		// Field: Socket struct address. Redacted due to the same reason as
 		// the 'Num' field in /proc/net/unix, see netUnix.ReadSeqFileData.
 		fmt.Fprintf(buf, "%#016p ", (*socket.Socket)(nil))
 
-		// Field: retransmit timeout. Unimplemented.
-		fmt.Fprintf(buf, "%d ", 0)
+		// Field: retransmit timeout, in clock ticks.
+		fmt.Fprintf(buf, "%d ", linux.ClockTFromDuration(info.RTO))
 
 		// Field: predicted tick of soft clock (delayed ACK control data).
-		// Unimplemented.
+		// Netstack doesn't delay ACKs.
 		fmt.Fprintf(buf, "%d ", 0)
 
-		// Field: (ack.quick<<1)|ack.pingpong, Unimplemented.
+		// Field: (ack.quick<<1)|ack.pingpong. Netstack doesn't delay ACKs.
 		fmt.Fprintf(buf, "%d ", 0)
 
-		// Field: sending congestion window, Unimplemented.
-		fmt.Fprintf(buf, "%d ", 0)
-
-		// Field: Slow start size threshold, -1 if threshold >= 0xFFFF.
-		// Unimplemented, report as large threshold.
-		fmt.Fprintf(buf, "%d", -1)
+		// Field: sending congestion window.
+		fmt.Fprintf(buf, "%d ", info.SndCwnd)
+
+		// Field: Slow start size threshold, -1 if threshold >= 0xFFFF or
+		// unset. For listening sockets, the maximum TCP Fast Open queue
+		// length.
+		if e.state == linux.TCP_LISTEN && e.ep != nil {
+			qlen, _ := e.ep.GetSockOptInt(tcpip.TCPFastOpenQueueLenOption)
+			fmt.Fprintf(buf, "%d", qlen)
+		} else if info.SndSsthresh >= 0xFFFF || info.SndSsthresh == 0 {
+			fmt.Fprintf(buf, "%d", -1)
+		} else {
+			fmt.Fprintf(buf, "%d", info.SndSsthresh)
+		}
 
 		fmt.Fprintf(buf, "\n")
-
-		s.DecRef(ctx)
 	}
 
 	return nil
@@ -470,13 +597,14 @@ type netTCPData struct {
 	kernfs.DynamicBytesFile
 
 	kernel *kernel.Kernel
+	stack  inet.Stack
 }
 
 var _ dynamicInode = (*netTCPData)(nil)
 
 func (d *netTCPData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	buf.WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode                                                     \n")
-	return commonGenerateTCP(ctx, buf, d.kernel, linux.AF_INET)
+	return commonGenerateTCP(ctx, buf, d.kernel, d.stack, linux.AF_INET)
 }
 
 // netTCP6Data implements vfs.DynamicBytesSource for /proc/net/tcp6.
@@ -486,127 +614,169 @@ type netTCP6Data struct {
 	kernfs.DynamicBytesFile
 
 	kernel *kernel.Kernel
+	stack  inet.Stack
 }
 
 var _ dynamicInode = (*netTCP6Data)(nil)
 
 func (d *netTCP6Data) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	buf.WriteString("  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n")
-	return commonGenerateTCP(ctx, buf, d.kernel, linux.AF_INET6)
+	return commonGenerateTCP(ctx, buf, d.kernel, d.stack, linux.AF_INET6)
 }
 
-// netUDPData implements vfs.DynamicBytesSource for /proc/net/udp.
-//
-// +stateify savable
-type netUDPData struct {
-	kernfs.DynamicBytesFile
-
-	kernel *kernel.Kernel
-}
-
-var _ dynamicInode = (*netUDPData)(nil)
-
-// Generate implements vfs.DynamicBytesSource.Generate.
-func (d *netUDPData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	// t may be nil here if our caller is not part of a task goroutine. This can
-	// happen for example if we're here for "sentryctl cat". When t is nil,
-	// degrade gracefully and retrieve what we can.
-	t := kernel.TaskFromContext(ctx)
-
-	buf.WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops             \n")
+// commonGenerateDatagram writes the entries of /proc/net/udp{,6} if raw is
+// false, or /proc/net/raw{,6} if raw is true.
+func commonGenerateDatagram(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel, family int, raw bool) error {
+	entries, _ := listInetSockets(ctx, k, family, func(stype linux.SockType, protocol int) bool {
+		if raw {
+			return stype == linux.SOCK_RAW
+		}
+		return stype == linux.SOCK_DGRAM && (protocol == 0 || protocol == linux.IPPROTO_UDP)
+	})
 
-	for _, se := range d.kernel.ListSockets() {
-		s := se.SockVFS2
-		if !s.TryIncRef() {
-			// Racing with socket destruction, this is ok.
-			continue
+	for _, e := range entries {
+		// For Linux's implementation, see net/ipv4/udp.c:udp4_format_sock()
+		// and net/ipv4/raw.c:raw_sock_seq_show().
+		var (
+			txQueue, rxQueue int
+			drops            uint64
+		)
+		if e.ep != nil {
+			txQueue, _ = e.ep.GetSockOptInt(tcpip.SendQueueSizeOption)
+			rxQueue, _ = e.ep.GetSockOptInt(tcpip.ReceiveBufferUsedOption)
+			if stats, ok := e.ep.Stats().(*tcpip.TransportEndpointStats); ok {
+				drops = stats.ReceiveErrors.ReceiveBufferOverflow.Value()
+			}
+			if raw {
+				// Raw sockets have no ports; Linux reports their protocol
+				// as the local port.
+				if info, ok := e.ep.Info().(*tcpipstack.TransportEndpointInfo); ok {
+					e.local, _ = socket.ConvertAddress(family, tcpip.FullAddress{Addr: info.ID.LocalAddress, Port: uint16(info.TransProto)})
+				}
+			}
 		}
-		sops, ok := s.Impl().(socket.SocketVFS2)
-		if !ok {
-			panic(fmt.Sprintf("Found non-socket file in socket table: %+v", s))
+		if txQueue < 0 {
+			txQueue = 0
 		}
-		if family, stype, _ := sops.Type(); family != linux.AF_INET || stype != linux.SOCK_DGRAM {
-			s.DecRef(ctx)
-			// Not udp4 socket.
-			continue
+		if rxQueue < 0 {
+			rxQueue = 0
 		}
 
-		// For Linux's implementation, see net/ipv4/udp.c:udp4_format_sock().
-
 		// Field: sl; entry number.
-		fmt.Fprintf(buf, "%5d: ", se.ID)
+		fmt.Fprintf(buf, "%5d: ", e.sl)
 
 		// Field: local_adddress.
-		var localAddr linux.SockAddrInet
-		if t != nil {
-			if local, _, err := sops.GetSockName(t); err == nil {
-				localAddr = *local.(*linux.SockAddrInet)
-			}
-		}
-		writeInetAddr(buf, linux.AF_INET, &localAddr)
+		writeInetAddr(buf, family, e.local)
 
 		// Field: rem_address.
-		var remoteAddr linux.SockAddrInet
-		if t != nil {
-			if remote, _, err := sops.GetPeerName(t); err == nil {
-				remoteAddr = *remote.(*linux.SockAddrInet)
-			}
-		}
-		writeInetAddr(buf, linux.AF_INET, &remoteAddr)
+		writeInetAddr(buf, family, e.remote)
 
 		// Field: state; socket state.
-		fmt.Fprintf(buf, "%02X ", sops.State())
+		fmt.Fprintf(buf, "%02X ", e.state)
 
-		// Field: tx_queue, rx_queue; number of packets in the transmit and
-		// receive queue. Unimplemented.
-		fmt.Fprintf(buf, "%08X:%08X ", 0, 0)
+		// Field: tx_queue, rx_queue; number of bytes in the transmit and
+		// receive queue.
+		fmt.Fprintf(buf, "%08X:%08X ", txQueue, rxQueue)
 
-		// Field: tr, tm->when. Always 0 for UDP.
+		// Field: tr, tm->when. Always 0 for datagram sockets.
 		fmt.Fprintf(buf, "%02X:%08X ", 0, 0)
 
-		// Field: retrnsmt. Always 0 for UDP.
+		// Field: retrnsmt. Always 0 for datagram sockets.
 		fmt.Fprintf(buf, "%08X ", 0)
 
-		stat, statErr := s.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_UID | linux.STATX_INO})
-
 		// Field: uid.
-		if statErr != nil || stat.Mask&linux.STATX_UID == 0 {
-			log.Warningf("Failed to retrieve uid for socket file: %v", statErr)
-			fmt.Fprintf(buf, "%5d ", 0)
-		} else {
-			creds := auth.CredentialsFromContext(ctx)
-			fmt.Fprintf(buf, "%5d ", uint32(auth.KUID(stat.UID).In(creds.UserNamespace).OrOverflow()))
-		}
+		fmt.Fprintf(buf, "%5d ", e.uid)
 
-		// Field: timeout. Always 0 for UDP.
+		// Field: timeout. Always 0 for datagram sockets.
 		fmt.Fprintf(buf, "%8d ", 0)
 
 		// Field: inode.
-		if statErr != nil || stat.Mask&linux.STATX_INO == 0 {
-			log.Warningf("Failed to retrieve inode for socket file: %v", statErr)
-			fmt.Fprintf(buf, "%8d ", 0)
-		} else {
-			fmt.Fprintf(buf, "%8d ", stat.Ino)
-		}
+		fmt.Fprintf(buf, "%8d ", e.ino)
 
-		// Field: ref; reference count on the socket inode. Don't count the ref
-		// we obtain while deferencing the weakref to this socket.
-		fmt.Fprintf(buf, "%d ", s.ReadRefs()-1)
+		// Field: ref; reference count on the socket inode.
+		fmt.Fprintf(buf, "%d ", e.refs)
 
 		// Field: Socket struct address. Redacted due to the same reason as
 		// the 'Num' field in /proc/net/unix, see netUnix.ReadSeqFileData.
 		fmt.Fprintf(buf, "%#016p ", (*socket.Socket)(nil))
 
-		// Field: drops; number of dropped packets. Unimplemented.
-		fmt.Fprintf(buf, "%d", 0)
+		// Field: drops; number of packets dropped because the receive
+		// buffer was full.
+		fmt.Fprintf(buf, "%d", drops)
 
 		fmt.Fprintf(buf, "\n")
-
-		s.DecRef(ctx)
 	}
 	return nil
 }
 
+// netUDPData implements vfs.DynamicBytesSource for /proc/net/udp.
+//
+// +stateify savable
+type netUDPData struct {
+	kernfs.DynamicBytesFile
+
+	kernel *kernel.Kernel
+}
+
+var _ dynamicInode = (*netUDPData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *netUDPData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops             \n")
+	return commonGenerateDatagram(ctx, buf, d.kernel, linux.AF_INET, false /* raw */)
+}
+
+// netUDP6Data implements vfs.DynamicBytesSource for /proc/net/udp6.
+//
+// +stateify savable
+type netUDP6Data struct {
+	kernfs.DynamicBytesFile
+
+	kernel *kernel.Kernel
+}
+
+var _ dynamicInode = (*netUDP6Data)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *netUDP6Data) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString("  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n")
+	return commonGenerateDatagram(ctx, buf, d.kernel, linux.AF_INET6, false /* raw */)
+}
+
+// netRawData implements vfs.DynamicBytesSource for /proc/net/raw.
+//
+// +stateify savable
+type netRawData struct {
+	kernfs.DynamicBytesFile
+
+	kernel *kernel.Kernel
+}
+
+var _ dynamicInode = (*netRawData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *netRawData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n")
+	return commonGenerateDatagram(ctx, buf, d.kernel, linux.AF_INET, true /* raw */)
+}
+
+// netRaw6Data implements vfs.DynamicBytesSource for /proc/net/raw6.
+//
+// +stateify savable
+type netRaw6Data struct {
+	kernfs.DynamicBytesFile
+
+	kernel *kernel.Kernel
+}
+
+var _ dynamicInode = (*netRaw6Data)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *netRaw6Data) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString("  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n")
+	return commonGenerateDatagram(ctx, buf, d.kernel, linux.AF_INET6, true /* raw */)
+}
+
 // netSnmpData implements vfs.DynamicBytesSource for /proc/net/snmp.
 //
 // +stateify savable
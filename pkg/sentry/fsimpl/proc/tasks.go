@@ -15,7 +15,6 @@
 package proc
 
 import (
-	"bytes"
 	"sort"
 	"strconv"
 
@@ -67,13 +66,16 @@ func (fs *filesystem) newTasksInode(ctx context.Context, k *kernel.Kernel, pidns
 	root := auth.NewRootCredentials(pidns.UserNamespace())
 	contents := map[string]kernfs.Inode{
 		"cmdline":        fs.newInode(ctx, root, 0444, &cmdLineData{}),
-		"cpuinfo":        fs.newInode(ctx, root, 0444, newStaticFileSetStat(cpuInfoData(k))),
+		"cpuinfo":        fs.newInode(ctx, root, 0444, &cpuinfoData{}),
 		"filesystems":    fs.newInode(ctx, root, 0444, &filesystemsData{}),
+		"keys":           fs.newInode(ctx, root, 0444, &keysData{}),
 		"loadavg":        fs.newInode(ctx, root, 0444, &loadavgData{}),
 		"sys":            fs.newSysDir(ctx, root, k),
+		"sysvipc":        fs.newSysvipcDir(ctx, root),
 		"meminfo":        fs.newInode(ctx, root, 0444, &meminfoData{}),
 		"mounts":         kernfs.NewStaticSymlink(ctx, root, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), "self/mounts"),
 		"net":            kernfs.NewStaticSymlink(ctx, root, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), "self/net"),
+		"pressure":       fs.newPressureDir(ctx, root),
 		"sentry-meminfo": fs.newInode(ctx, root, 0444, &sentryMeminfoData{}),
 		"stat":           fs.newInode(ctx, root, 0444, &statData{}),
 		"uptime":         fs.newInode(ctx, root, 0444, &uptimeData{}),
@@ -257,15 +259,6 @@ func newStaticFileSetStat(data string) *staticFileSetStat {
 	return &staticFileSetStat{StaticData: vfs.StaticData{Data: data}}
 }
 
-func cpuInfoData(k *kernel.Kernel) string {
-	features := k.FeatureSet()
-	var buf bytes.Buffer
-	for i, max := uint(0), k.ApplicationCores(); i < max; i++ {
-		features.WriteCPUInfoTo(i, &buf)
-	}
-	return buf.String()
-}
-
 func ipcData(v uint64) dynamicInode {
 	return newStaticFile(strconv.FormatUint(v, 10))
 }
@@ -254,6 +254,25 @@ func (*loadavgData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// cpuinfoData implements vfs.DynamicBytesSource for /proc/cpuinfo.
+//
+// +stateify savable
+type cpuinfoData struct {
+	dynamicBytesFileSetAttr
+}
+
+var _ dynamicInode = (*cpuinfoData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*cpuinfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	k := kernel.KernelFromContext(ctx)
+	features := k.FeatureSet()
+	for i, max := uint(0), k.ApplicationCores(); i < max; i++ {
+		features.WriteCPUInfoTo(i, buf)
+	}
+	return nil
+}
+
 // meminfoData implements vfs.DynamicBytesSource for /proc/meminfo.
 //
 // +stateify savable
@@ -298,8 +317,9 @@ func (*meminfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "Inactive(file): %8d kB\n", inactiveFile/1024)
 	fmt.Fprintf(buf, "Unevictable:           0 kB\n") // TODO(b/31823263)
 	fmt.Fprintf(buf, "Mlocked:               0 kB\n") // TODO(b/31823263)
-	fmt.Fprintf(buf, "SwapTotal:             0 kB\n")
-	fmt.Fprintf(buf, "SwapFree:              0 kB\n")
+	swapTotal, swapUsed := mf.SwapUsage()
+	fmt.Fprintf(buf, "SwapTotal:      %8d kB\n", swapTotal/1024)
+	fmt.Fprintf(buf, "SwapFree:       %8d kB\n", (swapTotal-swapUsed)/1024)
 	fmt.Fprintf(buf, "Dirty:                 0 kB\n")
 	fmt.Fprintf(buf, "Writeback:             0 kB\n")
 	fmt.Fprintf(buf, "AnonPages:      %8d kB\n", anon/1024)
@@ -322,8 +342,15 @@ func (*uptimeData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	k := kernel.KernelFromContext(ctx)
 	now := time.NowFromContext(ctx)
 
+	uptime := now.Sub(k.Timekeeper().BootTime())
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		// Apply the reader's CLOCK_BOOTTIME offset, as in Linux.
+		_, boottime := t.TimeNamespace().Offsets()
+		uptime += boottime
+	}
+
 	// Pretend that we've spent zero time sleeping (second number).
-	fmt.Fprintf(buf, "%.2f 0.00\n", now.Sub(k.Timekeeper().BootTime()).Seconds())
+	fmt.Fprintf(buf, "%.2f 0.00\n", uptime.Seconds())
 	return nil
 }
 
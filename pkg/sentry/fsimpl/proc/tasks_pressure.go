@@ -0,0 +1,201 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// pressureTriggerMaxLen is the maximum length of a trigger written to a
+// pressure file, from Linux's kernel/sched/psi.c:psi_write().
+const pressureTriggerMaxLen = 128
+
+func (fs *filesystem) newPressureDir(ctx context.Context, root *auth.Credentials) kernfs.Inode {
+	return fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+		"cpu":    fs.newPressureInode(ctx, root, kernel.PressureCPU),
+		"io":     fs.newPressureInode(ctx, root, kernel.PressureIO),
+		"memory": fs.newPressureInode(ctx, root, kernel.PressureMemory),
+	})
+}
+
+// pressureInode implements kernfs.Inode for /proc/pressure/{cpu,io,memory}.
+//
+// +stateify savable
+type pressureInode struct {
+	kernfs.DynamicBytesFile
+
+	res kernel.PressureResource
+}
+
+var _ dynamicInode = (*pressureInode)(nil)
+
+func (fs *filesystem) newPressureInode(ctx context.Context, root *auth.Credentials, res kernel.PressureResource) kernfs.Inode {
+	i := &pressureInode{res: res}
+	i.DynamicBytesFile.Init(ctx, root, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), i, 0666)
+	return i
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (i *pressureInode) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	stats := kernel.KernelFromContext(ctx).PressureStats(i.res)
+	stats.WriteTo(buf)
+	return nil
+}
+
+// Open implements kernfs.Inode.Open.
+func (i *pressureInode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &pressureFD{inode: i, k: kernel.KernelFromContext(ctx)}
+	fd.LockFD.Init(i.Locks())
+	if err := fd.vfsfd.Init(fd, opts.Flags, rp.Mount(), d.VFSDentry(), &vfs.FileDescriptionOptions{}); err != nil {
+		return nil, err
+	}
+	fd.DynamicBytesFileDescriptionImpl.Init(&fd.vfsfd, i)
+	return &fd.vfsfd, nil
+}
+
+// pressureFD implements vfs.FileDescriptionImpl for pressureInode. Writing a
+// trigger to it, e.g. "some 150000 1000000", arms a kernel.PressureTrigger
+// that raises EPOLLPRI.
+//
+// +stateify savable
+type pressureFD struct {
+	vfs.FileDescriptionDefaultImpl
+	vfs.DynamicBytesFileDescriptionImpl
+	vfs.LockFD
+
+	vfsfd vfs.FileDescription
+	inode *pressureInode
+
+	// k is the kernel that owns trigger. k is immutable.
+	k *kernel.Kernel
+
+	// queue is notified when trigger fires.
+	queue waiter.Queue
+
+	// mu protects trigger.
+	mu sync.Mutex `state:"nosave"`
+
+	// trigger is the trigger written to the FD, or nil if none has been
+	// written.
+	trigger *kernel.PressureTrigger
+}
+
+// Seek implements vfs.FileDescriptionImpl.Seek.
+func (fd *pressureFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	return fd.DynamicBytesFileDescriptionImpl.Seek(ctx, offset, whence)
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *pressureFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	return fd.DynamicBytesFileDescriptionImpl.Read(ctx, dst, opts)
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *pressureFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	return fd.DynamicBytesFileDescriptionImpl.PRead(ctx, dst, offset, opts)
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *pressureFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	return fd.PWrite(ctx, src, 0, opts)
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (fd *pressureFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, pressureTriggerMaxLen)
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	spec := strings.TrimRight(string(buf[:n]), "\x00\n")
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.trigger != nil {
+		// Only one trigger may be armed per FD.
+		return 0, linuxerr.EBUSY
+	}
+	tr, err := fd.k.NewPressureTrigger(fd.inode.res, spec, &fd.queue)
+	if err != nil {
+		return 0, err
+	}
+	fd.trigger = tr
+	return src.NumBytes(), nil
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *pressureFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	fd.mu.Lock()
+	tr := fd.trigger
+	fd.mu.Unlock()
+	if tr == nil {
+		// As in Linux's psi_trigger_poll(), FDs without triggers are always
+		// ready.
+		return mask & (waiter.ReadableEvents | waiter.WritableEvents | waiter.EventErr | waiter.EventPri)
+	}
+	return fd.k.PressureTriggerReadiness(tr, mask)
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *pressureFD) EventRegister(e *waiter.Entry) error {
+	fd.queue.EventRegister(e)
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *pressureFD) EventUnregister(e *waiter.Entry) {
+	fd.queue.EventUnregister(e)
+}
+
+// Epollable implements FileDescriptionImpl.Epollable.
+func (fd *pressureFD) Epollable() bool {
+	return true
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *pressureFD) Release(context.Context) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.trigger != nil {
+		fd.k.DestroyPressureTrigger(fd.trigger)
+		fd.trigger = nil
+	}
+}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *pressureFD) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
+	fs := fd.vfsfd.VirtualDentry().Mount().Filesystem()
+	return fd.inode.Stat(ctx, fs, opts)
+}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *pressureFD) SetStat(context.Context, vfs.SetStatOptions) error {
+	return linuxerr.EPERM
+}
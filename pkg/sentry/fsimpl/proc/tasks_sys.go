@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -30,6 +31,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
@@ -45,18 +47,29 @@ const (
 func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *kernel.Kernel) kernfs.Inode {
 	return fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 		"kernel": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-			"hostname": fs.newInode(ctx, root, 0444, &hostnameData{}),
-			"sem":      fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\t%d\t%d\t%d\n", linux.SEMMSL, linux.SEMMNS, linux.SEMOPM, linux.SEMMNI))),
-			"shmall":   fs.newInode(ctx, root, 0444, ipcData(linux.SHMALL)),
-			"shmmax":   fs.newInode(ctx, root, 0444, ipcData(linux.SHMMAX)),
-			"shmmni":   fs.newInode(ctx, root, 0444, ipcData(linux.SHMMNI)),
-			"msgmni":   fs.newInode(ctx, root, 0444, ipcData(linux.MSGMNI)),
-			"msgmax":   fs.newInode(ctx, root, 0444, ipcData(linux.MSGMAX)),
-			"msgmnb":   fs.newInode(ctx, root, 0444, ipcData(linux.MSGMNB)),
+			"core_pattern": fs.newInode(ctx, root, 0644, &corePatternData{k: k}),
+			"hostname":     fs.newInode(ctx, root, 0444, &hostnameData{}),
+			"keys":         fs.newKeysSysDir(ctx, root, k),
+			"sem":          fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\t%d\t%d\t%d\n", linux.SEMMSL, linux.SEMMNS, linux.SEMOPM, linux.SEMMNI))),
+			"shmall":       fs.newInode(ctx, root, 0444, ipcData(linux.SHMALL)),
+			"shmmax":       fs.newInode(ctx, root, 0444, ipcData(linux.SHMMAX)),
+			"shmmni":       fs.newInode(ctx, root, 0444, ipcData(linux.SHMMNI)),
+			"msgmni":       fs.newInode(ctx, root, 0444, ipcData(linux.MSGMNI)),
+			"msgmax":       fs.newInode(ctx, root, 0444, ipcData(linux.MSGMAX)),
+			"msgmnb":       fs.newInode(ctx, root, 0444, ipcData(linux.MSGMNB)),
 			"yama": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 				"ptrace_scope": fs.newYAMAPtraceScopeFile(ctx, k, root),
 			}),
 		}),
+		"fs": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			"mqueue": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+				"msg_default":     fs.newInode(ctx, root, 0444, ipcData(uint64(linux.DFLT_MSG))),
+				"msg_max":         fs.newInode(ctx, root, 0444, ipcData(linux.DFLT_MSGMAX)),
+				"msgsize_default": fs.newInode(ctx, root, 0444, ipcData(uint64(linux.DFLT_MSGSIZE))),
+				"msgsize_max":     fs.newInode(ctx, root, 0444, ipcData(linux.DFLT_MSGSIZEMAX)),
+				"queues_max":      fs.newInode(ctx, root, 0444, ipcData(linux.DFLT_QUEUESMAX)),
+			}),
+		}),
 		"vm": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 			"max_map_count":     fs.newInode(ctx, root, 0444, newStaticFile("2147483647\n")),
 			"mmap_min_addr":     fs.newInode(ctx, root, 0444, &mmapMinAddrData{k: k}),
@@ -77,6 +90,7 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 			"ipv4": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 				"ip_forward":          fs.newInode(ctx, root, 0444, &ipForwarding{stack: stack}),
 				"ip_local_port_range": fs.newInode(ctx, root, 0644, &portRange{stack: stack}),
+				"ping_group_range":    fs.newInode(ctx, root, 0644, &pingGroupRange{}),
 				"tcp_recovery":        fs.newInode(ctx, root, 0644, &tcpRecoveryData{stack: stack}),
 				"tcp_rmem":            fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpRMem}),
 				"tcp_sack":            fs.newInode(ctx, root, 0644, &tcpSackData{stack: stack}),
@@ -115,7 +129,7 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				"tcp_probe_interval":        fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_probe_threshold":       fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_retries1":              fs.newInode(ctx, root, 0444, newStaticFile("3")),
-				"tcp_retries2":              fs.newInode(ctx, root, 0444, newStaticFile("15")),
+				"tcp_retries2":              fs.newInode(ctx, root, 0644, &tcpRetries2Data{}),
 				"tcp_rfc1337":               fs.newInode(ctx, root, 0444, newStaticFile("1")),
 				"tcp_slow_start_after_idle": fs.newInode(ctx, root, 0444, newStaticFile("1")),
 				"tcp_synack_retries":        fs.newInode(ctx, root, 0444, newStaticFile("5")),
@@ -123,6 +137,8 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				"tcp_timestamps":            fs.newInode(ctx, root, 0444, newStaticFile("1")),
 			}),
 			"core": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+				"busy_poll":     fs.newInode(ctx, root, 0644, &busyPollData{k: k}),
+				"busy_read":     fs.newInode(ctx, root, 0644, &busyPollData{k: k, read: true}),
 				"default_qdisc": fs.newInode(ctx, root, 0444, newStaticFile("pfifo_fast")),
 				"message_burst": fs.newInode(ctx, root, 0444, newStaticFile("10")),
 				"message_cost":  fs.newInode(ctx, root, 0444, newStaticFile("5")),
@@ -134,6 +150,16 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				"wmem_max":      fs.newInode(ctx, root, 0444, newStaticFile("212992")),
 			}),
 		}
+		// Connections are only tracked by netstack.
+		if _, err := stack.ConnTrackMax(); err == nil {
+			contents["netfilter"] = fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+				"nf_conntrack_count":                   fs.newInode(ctx, root, 0444, &connTrackData{stack: stack, param: connTrackCount}),
+				"nf_conntrack_max":                     fs.newInode(ctx, root, 0644, &connTrackData{stack: stack, param: connTrackMax}),
+				"nf_conntrack_tcp_timeout_established": fs.newInode(ctx, root, 0644, &connTrackData{stack: stack, param: connTrackTCPTimeoutEstablished}),
+				"nf_conntrack_udp_timeout":             fs.newInode(ctx, root, 0644, &connTrackData{stack: stack, param: connTrackUDPTimeout}),
+				"nf_conntrack_udp_timeout_stream":      fs.newInode(ctx, root, 0644, &connTrackData{stack: stack, param: connTrackUDPTimeoutStream}),
+			})
+		}
 	}
 
 	return fs.newStaticDir(ctx, root, contents)
@@ -174,6 +200,56 @@ func (*hostnameData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// corePatternData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/kernel/core_pattern.
+//
+// +stateify savable
+type corePatternData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+}
+
+var _ vfs.WritableDynamicBytesSource = (*corePatternData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *corePatternData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString(d.k.CorePattern())
+	buf.WriteString("\n")
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *corePatternData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	// Like Linux, silently truncate the pattern to CORENAME_MAX_SIZE bytes.
+	const corenameMaxSize = 128
+	b := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, b)
+	if err != nil {
+		return 0, err
+	}
+	b = b[:n]
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	if len(b) > corenameMaxSize-1 {
+		b = b[:corenameMaxSize-1]
+	}
+	d.k.SetCorePattern(string(b))
+	return int64(n), nil
+}
+
 // tcpSackData implements vfs.WritableDynamicBytesSource for
 // /proc/sys/net/tcp_sack.
 //
@@ -484,3 +560,301 @@ func (pr *portRange) Write(ctx context.Context, _ *vfs.FileDescription, src user
 	*pr.end = uint16(ports[1])
 	return n, nil
 }
+
+// pingGroupRange implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/ping_group_range. It reflects the network namespace of
+// the caller.
+//
+// +stateify savable
+type pingGroupRange struct {
+	kernfs.DynamicBytesFile
+}
+
+var _ vfs.WritableDynamicBytesSource = (*pingGroupRange)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*pingGroupRange) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return linuxerr.ESRCH
+	}
+	userns := auth.CredentialsFromContext(ctx).UserNamespace
+	min, max := t.NetworkNamespace().PingGroupRange()
+	_, err := fmt.Fprintf(buf, "%d\t%d\n", min.In(userns).OrOverflow(), max.In(userns).OrOverflow())
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (*pingGroupRange) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return 0, linuxerr.ESRCH
+	}
+
+	// Limit input size so as not to impact performance if input size is
+	// large.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	gids := make([]int32, 2)
+	n, err := usermem.CopyInt32StringsInVec(ctx, src.IO, src.Addrs, gids, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+
+	// Compare Linux's net/ipv4/sysctl_net_ipv4.c:ipv4_ping_group_range().
+	for _, gid := range gids {
+		if gid < 0 || auth.KGID(gid) > inet.MaxPingGroup {
+			return 0, linuxerr.EINVAL
+		}
+	}
+	userns := auth.CredentialsFromContext(ctx).UserNamespace
+	min := userns.MapToKGID(auth.GID(gids[0]))
+	max := userns.MapToKGID(auth.GID(gids[1]))
+	if !min.Ok() || !max.Ok() {
+		return 0, linuxerr.EINVAL
+	}
+	if gids[1] < gids[0] || max < min {
+		// An empty range disallows all groups.
+		min, max = 1, 0
+	}
+	t.NetworkNamespace().SetPingGroupRange(min, max)
+	return n, nil
+}
+
+// tcpRetries2Data implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_retries2. It reflects the network namespace of the
+// caller.
+//
+// +stateify savable
+type tcpRetries2Data struct {
+	kernfs.DynamicBytesFile
+}
+
+var _ vfs.WritableDynamicBytesSource = (*tcpRetries2Data)(nil)
+
+// callerStack returns the network stack of the caller's network namespace.
+func callerStack(ctx context.Context) (inet.Stack, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return nil, linuxerr.ESRCH
+	}
+	stack := t.NetworkNamespace().Stack()
+	if stack == nil {
+		return nil, linuxerr.ENOENT
+	}
+	return stack, nil
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*tcpRetries2Data) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	stack, err := callerStack(ctx)
+	if err != nil {
+		return err
+	}
+	retries, err := stack.TCPRetries2()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(buf, "%d\n", retries)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (*tcpRetries2Data) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+	stack, err := callerStack(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if err := stack.SetTCPRetries2(uint32(v)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// busyPollData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/core/busy_read and /proc/sys/net/core/busy_poll.
+//
+// +stateify savable
+type busyPollData struct {
+	kernfs.DynamicBytesFile
+
+	k *kernel.Kernel
+
+	// read is true for busy_read, and false for busy_poll.
+	read bool
+}
+
+var _ vfs.WritableDynamicBytesSource = (*busyPollData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *busyPollData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	usec := d.k.NetBusyPoll()
+	if d.read {
+		usec = d.k.NetBusyRead()
+	}
+	_, err := fmt.Fprintf(buf, "%d\n", usec)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *busyPollData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if d.read {
+		d.k.SetNetBusyRead(uint32(v))
+	} else {
+		d.k.SetNetBusyPoll(uint32(v))
+	}
+	return n, nil
+}
+
+// connTrackParam identifies a connection tracking parameter exposed in
+// /proc/sys/net/netfilter.
+type connTrackParam int
+
+const (
+	connTrackCount connTrackParam = iota
+	connTrackMax
+	connTrackTCPTimeoutEstablished
+	connTrackUDPTimeout
+	connTrackUDPTimeoutStream
+)
+
+// connTrackTimeout returns the field of timeouts holding the timeout p.
+//
+// Preconditions: p is a timeout.
+func (p connTrackParam) connTrackTimeout(timeouts *stack.ConnTrackTimeouts) *time.Duration {
+	switch p {
+	case connTrackTCPTimeoutEstablished:
+		return &timeouts.TCPEstablished
+	case connTrackUDPTimeout:
+		return &timeouts.UDP
+	case connTrackUDPTimeoutStream:
+		return &timeouts.UDPStream
+	default:
+		panic(fmt.Sprintf("unknown connection tracking timeout %d", p))
+	}
+}
+
+// connTrackData implements vfs.WritableDynamicBytesSource for the files of
+// /proc/sys/net/netfilter. Timeouts are expressed in seconds.
+//
+// +stateify savable
+type connTrackData struct {
+	kernfs.DynamicBytesFile
+
+	param connTrackParam
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*connTrackData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *connTrackData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	var v int
+	var err error
+	switch d.param {
+	case connTrackCount:
+		v, err = d.stack.ConnTrackCount()
+	case connTrackMax:
+		v, err = d.stack.ConnTrackMax()
+	default:
+		var timeouts stack.ConnTrackTimeouts
+		timeouts, err = d.stack.ConnTrackTimeouts()
+		v = int(*d.param.connTrackTimeout(&timeouts) / time.Second)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(buf, "%d\n", v)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *connTrackData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	switch d.param {
+	case connTrackCount:
+		return 0, linuxerr.EACCES
+	case connTrackMax:
+		// As in Linux, 0 removes the limit.
+		if v < 0 {
+			return 0, linuxerr.EINVAL
+		}
+		err = d.stack.SetConnTrackMax(int(v))
+	default:
+		// Unlike Linux, netstack doesn't support timing out connections
+		// immediately.
+		if v <= 0 {
+			return 0, linuxerr.EINVAL
+		}
+		var timeouts stack.ConnTrackTimeouts
+		if timeouts, err = d.stack.ConnTrackTimeouts(); err != nil {
+			return 0, err
+		}
+		*d.param.connTrackTimeout(&timeouts) = time.Duration(v) * time.Second
+		err = d.stack.SetConnTrackTimeouts(timeouts)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
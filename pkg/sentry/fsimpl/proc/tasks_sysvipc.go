@@ -0,0 +1,134 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// newSysvipcDir returns the dentry corresponding to /proc/sysvipc directory.
+func (fs *filesystem) newSysvipcDir(ctx context.Context, root *auth.Credentials) kernfs.Inode {
+	return fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+		"msg": fs.newInode(ctx, root, 0444, &sysvipcMsgData{}),
+		"sem": fs.newInode(ctx, root, 0444, &sysvipcSemData{}),
+		"shm": fs.newInode(ctx, root, 0444, &sysvipcShmData{}),
+	})
+}
+
+// sysvipcMsgData implements vfs.DynamicBytesSource for /proc/sysvipc/msg.
+//
+// +stateify savable
+type sysvipcMsgData struct {
+	kernfs.DynamicBytesFile
+}
+
+var _ dynamicInode = (*sysvipcMsgData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*sysvipcMsgData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// See Linux's ipc/msg.c:sysvipc_msg_proc_show().
+	buf.WriteString("       key      msqid perms      cbytes       qnum lspid lrpid   uid   gid  cuid  cgid      stime      rtime      ctime\n")
+
+	// As in Linux, list the queues of the reader's IPC namespace.
+	ns := kernel.IPCNamespaceFromContext(ctx)
+	if ns == nil {
+		return nil
+	}
+	defer ns.DecRef(ctx)
+	for _, q := range ns.MsgqueueRegistry().Queues() {
+		ds, err := q.StatAny(ctx)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(buf, "%10d %10d  %4o  %10d %10d %5d %5d %5d %5d %5d %5d %10d %10d %10d\n",
+			int32(ds.MsgPerm.Key), q.ID(), ds.MsgPerm.Mode, ds.MsgCbytes, ds.MsgQnum,
+			ds.MsgLspid, ds.MsgLrpid, ds.MsgPerm.UID, ds.MsgPerm.GID, ds.MsgPerm.CUID,
+			ds.MsgPerm.CGID, ds.MsgStime, ds.MsgRtime, ds.MsgCtime)
+	}
+	return nil
+}
+
+// sysvipcSemData implements vfs.DynamicBytesSource for /proc/sysvipc/sem.
+//
+// +stateify savable
+type sysvipcSemData struct {
+	kernfs.DynamicBytesFile
+}
+
+var _ dynamicInode = (*sysvipcSemData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*sysvipcSemData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// See Linux's ipc/sem.c:sysvipc_sem_proc_show().
+	buf.WriteString("       key      semid perms      nsems   uid   gid  cuid  cgid      otime      ctime\n")
+
+	ns := kernel.IPCNamespaceFromContext(ctx)
+	if ns == nil {
+		return nil
+	}
+	defer ns.DecRef(ctx)
+	creds := auth.CredentialsFromContext(ctx)
+	for _, set := range ns.SemaphoreRegistry().Sets() {
+		ds, err := set.GetStatAny(creds)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(buf, "%10d %10d  %4o %10d %5d %5d %5d %5d %10d %10d\n",
+			int32(ds.SemPerm.Key), set.ID(), ds.SemPerm.Mode, ds.SemNSems,
+			ds.SemPerm.UID, ds.SemPerm.GID, ds.SemPerm.CUID, ds.SemPerm.CGID,
+			ds.SemOTime, ds.SemCTime)
+	}
+	return nil
+}
+
+// sysvipcShmData implements vfs.DynamicBytesSource for /proc/sysvipc/shm.
+//
+// +stateify savable
+type sysvipcShmData struct {
+	kernfs.DynamicBytesFile
+}
+
+var _ dynamicInode = (*sysvipcShmData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*sysvipcShmData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// See Linux's ipc/shm.c:sysvipc_shm_proc_show().
+	buf.WriteString("       key      shmid perms                  size  cpid  lpid nattch   uid   gid  cuid  cgid      atime      dtime      ctime                   rss                  swap\n")
+
+	ns := kernel.IPCNamespaceFromContext(ctx)
+	if ns == nil {
+		return nil
+	}
+	defer ns.DecRef(ctx)
+	for _, s := range ns.ShmRegistry().Segments() {
+		ds, err := s.IPCStatAny(ctx)
+		if err == nil {
+			// Segments are always fully backed by memory, and are never
+			// swapped.
+			fmt.Fprintf(buf, "%10d %10d  %4o %21d %5d %5d  %5d %5d %5d %5d %5d %10d %10d %10d %21d %21d\n",
+				int32(ds.ShmPerm.Key), s.ID(), ds.ShmPerm.Mode, ds.ShmSegsz, ds.ShmCpid,
+				ds.ShmLpid, ds.ShmNattach, ds.ShmPerm.UID, ds.ShmPerm.GID, ds.ShmPerm.CUID,
+				ds.ShmPerm.CGID, ds.ShmAtime, ds.ShmDtime, ds.ShmCtime, s.EffectiveSize(), 0)
+		}
+		s.DecRef(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// defaultCPUPeriod is the default CFS bandwidth period in microseconds.
+const defaultCPUPeriod = 100000
+
+// CgroupLimits are the resource limits of the container, presented in a
+// read-only cgroup v2 view at fs/cgroup.
+//
+// +stateify savable
+type CgroupLimits struct {
+	// CPUQuota is the CFS bandwidth quota in microseconds per CPUPeriod. If
+	// CPUQuota is not positive, CPU usage is unlimited.
+	CPUQuota int64
+
+	// CPUPeriod is the CFS bandwidth period in microseconds. If CPUPeriod is
+	// 0, the default period of 100ms is used.
+	CPUPeriod uint64
+
+	// MemoryLimit is the memory limit in bytes. If MemoryLimit is not
+	// positive, memory usage is unlimited.
+	MemoryLimit int64
+}
+
+// cgroupDir returns the contents of fs/cgroup. Note that if the launcher
+// mounts cgroupfs at fs/cgroup, the mount hides this view.
+func cgroupDir(ctx context.Context, fs *filesystem, creds *auth.Credentials, limits *CgroupLimits) kernfs.Inode {
+	var children map[string]kernfs.Inode
+	if limits != nil {
+		children = map[string]kernfs.Inode{
+			"cgroup.controllers": fs.newStaticFile(ctx, creds, defaultSysMode, "cpu memory\n"),
+			"cpu.max":            fs.newCgroupFile(ctx, creds, &cpuMaxData{limits: *limits}),
+			"memory.current":     fs.newCgroupFile(ctx, creds, &memoryCurrentData{}),
+			"memory.max":         fs.newCgroupFile(ctx, creds, &memoryMaxData{limits: *limits}),
+		}
+	}
+	return fs.newDir(ctx, creds, defaultSysDirMode, children)
+}
+
+// cgroupFile implements kernfs.Inode for the files in fs/cgroup.
+//
+// +stateify savable
+type cgroupFile struct {
+	implStatFS
+	kernfs.DynamicBytesFile
+}
+
+func (fs *filesystem) newCgroupFile(ctx context.Context, creds *auth.Credentials, data vfs.DynamicBytesSource) kernfs.Inode {
+	c := &cgroupFile{}
+	c.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), data, defaultSysMode)
+	return c
+}
+
+// cpuMaxData implements vfs.DynamicBytesSource for fs/cgroup/cpu.max.
+//
+// +stateify savable
+type cpuMaxData struct {
+	limits CgroupLimits
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *cpuMaxData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	period := d.limits.CPUPeriod
+	if period == 0 {
+		period = defaultCPUPeriod
+	}
+	if d.limits.CPUQuota <= 0 {
+		fmt.Fprintf(buf, "max %d\n", period)
+		return nil
+	}
+	fmt.Fprintf(buf, "%d %d\n", d.limits.CPUQuota, period)
+	return nil
+}
+
+// memoryMaxData implements vfs.DynamicBytesSource for fs/cgroup/memory.max.
+//
+// +stateify savable
+type memoryMaxData struct {
+	limits CgroupLimits
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *memoryMaxData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if d.limits.MemoryLimit <= 0 {
+		buf.WriteString("max\n")
+		return nil
+	}
+	fmt.Fprintf(buf, "%d\n", d.limits.MemoryLimit)
+	return nil
+}
+
+// memoryCurrentData implements vfs.DynamicBytesSource for
+// fs/cgroup/memory.current.
+//
+// +stateify savable
+type memoryCurrentData struct{}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*memoryCurrentData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	mf := kernel.KernelFromContext(ctx).MemoryFile()
+	_ = mf.UpdateUsage() // Best effort
+	_, totalUsage := usage.MemoryAccounting.Copy()
+	fmt.Fprintf(buf, "%d\n", totalUsage)
+	return nil
+}
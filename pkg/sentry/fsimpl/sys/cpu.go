@@ -0,0 +1,214 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// cacheInfo describes a CPU cache for devices/system/cpu/cpuN/cache.
+type cacheInfo struct {
+	// level is the level of the cache (L1, L2, etc).
+	level uint32
+
+	// typ is one of "Data", "Instruction" or "Unified".
+	typ string
+
+	// size is the size of the cache in bytes.
+	size uint64
+
+	// lineSize is the size of a cache line in bytes.
+	lineSize uint32
+
+	// ways is the number of ways of associativity of the cache.
+	ways uint32
+
+	// sets is the number of sets in the cache.
+	sets uint32
+
+	// shared is true if the cache is shared by all CPUs rather than private
+	// to each CPU.
+	shared bool
+}
+
+func cpuDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) kernfs.Inode {
+	k := kernel.KernelFromContext(ctx)
+	maxCPUCores := k.ApplicationCores()
+	caches := cpuCaches(k.FeatureSet())
+	children := map[string]kernfs.Inode{
+		"online":   fs.newCPUFile(ctx, creds, linux.FileMode(0444)),
+		"possible": fs.newCPUFile(ctx, creds, linux.FileMode(0444)),
+		"present":  fs.newCPUFile(ctx, creds, linux.FileMode(0444)),
+	}
+	for i := uint(0); i < maxCPUCores; i++ {
+		children[fmt.Sprintf("cpu%d", i)] = fs.newDir(ctx, creds, linux.FileMode(0555), map[string]kernfs.Inode{
+			"cache":    cacheDir(ctx, fs, creds, i, caches),
+			"topology": topologyDir(ctx, fs, creds, i),
+		})
+	}
+	return fs.newDir(ctx, creds, defaultSysDirMode, children)
+}
+
+// topologyDir returns the topology directory of the given CPU. The sentry
+// presents all application CPUs as single-threaded cores in one package.
+func topologyDir(ctx context.Context, fs *filesystem, creds *auth.Credentials, cpu uint) kernfs.Inode {
+	id := fmt.Sprintf("%d\n", cpu)
+	return fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+		"core_id":              fs.newStaticFile(ctx, creds, defaultSysMode, id),
+		"core_siblings":        fs.newCPUMaskFile(ctx, creds, false /* list */, cpuAll),
+		"core_siblings_list":   fs.newCPUMaskFile(ctx, creds, true /* list */, cpuAll),
+		"die_id":               fs.newStaticFile(ctx, creds, defaultSysMode, "0\n"),
+		"physical_package_id":  fs.newStaticFile(ctx, creds, defaultSysMode, "0\n"),
+		"thread_siblings":      fs.newCPUMaskFile(ctx, creds, false /* list */, int(cpu)),
+		"thread_siblings_list": fs.newStaticFile(ctx, creds, defaultSysMode, id),
+		"package_cpus":         fs.newCPUMaskFile(ctx, creds, false /* list */, cpuAll),
+		"package_cpus_list":    fs.newCPUMaskFile(ctx, creds, true /* list */, cpuAll),
+		"core_cpus":            fs.newCPUMaskFile(ctx, creds, false /* list */, int(cpu)),
+		"core_cpus_list":       fs.newStaticFile(ctx, creds, defaultSysMode, id),
+	})
+}
+
+func cacheDir(ctx context.Context, fs *filesystem, creds *auth.Credentials, cpu uint, caches []cacheInfo) kernfs.Inode {
+	children := make(map[string]kernfs.Inode, len(caches))
+	for i, c := range caches {
+		sharedCPUs := int(cpu)
+		if c.shared {
+			sharedCPUs = cpuAll
+		}
+		children[fmt.Sprintf("index%d", i)] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"coherency_line_size":   fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", c.lineSize)),
+			"level":                 fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", c.level)),
+			"number_of_sets":        fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", c.sets)),
+			"shared_cpu_list":       fs.newCPUMaskFile(ctx, creds, true /* list */, sharedCPUs),
+			"shared_cpu_map":        fs.newCPUMaskFile(ctx, creds, false /* list */, sharedCPUs),
+			"size":                  fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%dK\n", c.size/1024)),
+			"type":                  fs.newStaticFile(ctx, creds, defaultSysMode, c.typ+"\n"),
+			"ways_of_associativity": fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", c.ways)),
+		})
+	}
+	return fs.newDir(ctx, creds, defaultSysDirMode, children)
+}
+
+// cpuFile implements kernfs.Inode.
+//
+// +stateify savable
+type cpuFile struct {
+	implStatFS
+	kernfs.DynamicBytesFile
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (c *cpuFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	maxCores := kernel.KernelFromContext(ctx).ApplicationCores()
+	fmt.Fprintf(buf, "0-%d\n", maxCores-1)
+	return nil
+}
+
+func (fs *filesystem) newCPUFile(ctx context.Context, creds *auth.Credentials, mode linux.FileMode) kernfs.Inode {
+	c := &cpuFile{}
+	c.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), c, mode)
+	return c
+}
+
+// cpuAll may be passed to newCPUMaskFile to represent all CPUs.
+const cpuAll = -1
+
+// cpuNode is the value of cpuMaskFile.cpu for files that contain the CPUs in a
+// NUMA node.
+const cpuNode = -2
+
+// cpuMaskFile implements kernfs.Inode for files that contain a set of CPUs,
+// either as a list of ranges or as a hexadecimal bitmask.
+//
+// +stateify savable
+type cpuMaskFile struct {
+	implStatFS
+	kernfs.DynamicBytesFile
+
+	// list is true if the set is formatted as a list.
+	list bool
+
+	// cpu is the only CPU in the set, cpuAll if the set contains all CPUs, or
+	// cpuNode if the set contains the CPUs in NUMA node node.
+	cpu int
+
+	// node is the NUMA node whose CPUs are in the set if cpu is cpuNode.
+	node int
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (c *cpuMaskFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	k := kernel.KernelFromContext(ctx)
+	maxCores := k.ApplicationCores()
+	// The set contains CPUs [start, end).
+	var start, end uint
+	switch c.cpu {
+	case cpuAll:
+		start, end = 0, maxCores
+	case cpuNode:
+		start, end = k.NUMANodeCPUs(c.node)
+	default:
+		start, end = uint(c.cpu), uint(c.cpu)+1
+	}
+	if c.list {
+		switch {
+		case end <= start:
+		case end-start == 1 && c.cpu != cpuAll:
+			fmt.Fprintf(buf, "%d", start)
+		default:
+			fmt.Fprintf(buf, "%d-%d", start, end-1)
+		}
+		buf.WriteByte('\n')
+		return nil
+	}
+	// Bitmasks are formatted as comma-separated 32-bit words, most
+	// significant first, covering all possible CPUs, as in Linux's
+	// bitmap_print_to_pagebuf().
+	words := make([]uint32, (maxCores+31)/32)
+	for i := start; i < end && i < maxCores; i++ {
+		words[i/32] |= 1 << (i % 32)
+	}
+	for i := len(words) - 1; i >= 0; i-- {
+		if i == len(words)-1 && maxCores%32 != 0 {
+			fmt.Fprintf(buf, "%0*x", int(maxCores%32+3)/4, words[i])
+		} else {
+			fmt.Fprintf(buf, "%08x", words[i])
+		}
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+	}
+	buf.WriteByte('\n')
+	return nil
+}
+
+func (fs *filesystem) newCPUMaskFile(ctx context.Context, creds *auth.Credentials, list bool, cpu int) kernfs.Inode {
+	c := &cpuMaskFile{list: list, cpu: cpu}
+	c.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), c, defaultSysMode)
+	return c
+}
+
+func (fs *filesystem) newNodeCPUMaskFile(ctx context.Context, creds *auth.Credentials, list bool, node int) kernfs.Inode {
+	c := &cpuMaskFile{list: list, cpu: cpuNode, node: node}
+	c.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), c, defaultSysMode)
+	return c
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64
+// +build amd64
+
+package sys
+
+import (
+	"gvisor.dev/gvisor/pkg/cpuid"
+)
+
+// cpuCaches returns the caches described by fs. Caches above L2 are assumed to
+// be shared by all CPUs.
+func cpuCaches(fs cpuid.FeatureSet) []cacheInfo {
+	var caches []cacheInfo
+	for _, c := range fs.Caches() {
+		ci := cacheInfo{
+			level:    c.Level,
+			lineSize: fs.CacheLine(),
+			ways:     c.Ways,
+			sets:     c.Sets,
+			shared:   c.Level > 2,
+		}
+		ci.size = uint64(ci.lineSize) * uint64(c.Partitions) * uint64(c.Ways) * uint64(c.Sets)
+		switch c.Type {
+		case cpuid.CacheData:
+			ci.typ = "Data"
+		case cpuid.CacheInstruction:
+			ci.typ = "Instruction"
+		case cpuid.CacheUnified:
+			ci.typ = "Unified"
+		default:
+			continue
+		}
+		caches = append(caches, ci)
+	}
+	return caches
+}
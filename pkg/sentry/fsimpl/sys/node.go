@@ -0,0 +1,131 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+)
+
+// Distances between NUMA nodes, as in Linux's include/linux/topology.h.
+const (
+	localDistance  = 10
+	remoteDistance = 20
+)
+
+// nodeDir returns /sys/devices/system/node, which describes the NUMA topology
+// presented to the application by the MemoryFile.
+func nodeDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) kernfs.Inode {
+	k := kernel.KernelFromContext(ctx)
+	nodes := k.NUMANodes()
+	var all, withCPUs []int
+	for i := 0; i < nodes; i++ {
+		all = append(all, i)
+		if start, end := k.NUMANodeCPUs(i); start < end {
+			withCPUs = append(withCPUs, i)
+		}
+	}
+	children := map[string]kernfs.Inode{
+		"has_cpu":           fs.newStaticFile(ctx, creds, defaultSysMode, nodeList(withCPUs)),
+		"has_memory":        fs.newStaticFile(ctx, creds, defaultSysMode, nodeList(all)),
+		"has_normal_memory": fs.newStaticFile(ctx, creds, defaultSysMode, nodeList(all)),
+		"online":            fs.newStaticFile(ctx, creds, defaultSysMode, nodeList(all)),
+		"possible":          fs.newStaticFile(ctx, creds, defaultSysMode, nodeList(all)),
+	}
+	for i := 0; i < nodes; i++ {
+		distances := make([]string, nodes)
+		for j := range distances {
+			if i == j {
+				distances[j] = fmt.Sprint(localDistance)
+			} else {
+				distances[j] = fmt.Sprint(remoteDistance)
+			}
+		}
+		children[fmt.Sprintf("node%d", i)] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"cpulist":  fs.newNodeCPUMaskFile(ctx, creds, true /* list */, i),
+			"cpumap":   fs.newNodeCPUMaskFile(ctx, creds, false /* list */, i),
+			"distance": fs.newStaticFile(ctx, creds, defaultSysMode, strings.Join(distances, " ")+"\n"),
+			"meminfo":  fs.newNodeMeminfoFile(ctx, creds, i),
+		})
+	}
+	return fs.newDir(ctx, creds, defaultSysDirMode, children)
+}
+
+// nodeList formats a sorted list of nodes as ranges, as in Linux's
+// bitmap_print_to_pagebuf() with list=true.
+func nodeList(nodes []int) string {
+	var buf strings.Builder
+	for i := 0; i < len(nodes); {
+		j := i
+		for j+1 < len(nodes) && nodes[j+1] == nodes[j]+1 {
+			j++
+		}
+		if buf.Len() != 0 {
+			buf.WriteByte(',')
+		}
+		if i == j {
+			fmt.Fprintf(&buf, "%d", nodes[i])
+		} else {
+			fmt.Fprintf(&buf, "%d-%d", nodes[i], nodes[j])
+		}
+		i = j + 1
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// nodeMeminfoFile implements kernfs.Inode for
+// /sys/devices/system/node/nodeN/meminfo.
+//
+// +stateify savable
+type nodeMeminfoFile struct {
+	implStatFS
+	kernfs.DynamicBytesFile
+
+	node int
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (m *nodeMeminfoFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	mf := kernel.KernelFromContext(ctx).MemoryFile()
+	_, totalUsage := usage.MemoryAccounting.Copy()
+	// Memory is split evenly between nodes.
+	total := usage.TotalMemory(mf.TotalSize(), totalUsage) / uint64(mf.NUMANodes())
+	var used uint64
+	if nodeUsage := mf.NUMAUsage(); m.node < len(nodeUsage) {
+		used = nodeUsage[m.node]
+	}
+	if used > total {
+		used = total
+	}
+	fmt.Fprintf(buf, "Node %d MemTotal:       %8d kB\n", m.node, total/1024)
+	fmt.Fprintf(buf, "Node %d MemFree:        %8d kB\n", m.node, (total-used)/1024)
+	fmt.Fprintf(buf, "Node %d MemUsed:        %8d kB\n", m.node, used/1024)
+	return nil
+}
+
+func (fs *filesystem) newNodeMeminfoFile(ctx context.Context, creds *auth.Credentials, node int) kernfs.Inode {
+	m := &nodeMeminfoFile{node: node}
+	m.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), m, defaultSysMode)
+	return m
+}
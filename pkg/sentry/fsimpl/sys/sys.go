@@ -16,7 +16,6 @@
 package sys
 
 import (
-	"bytes"
 	"fmt"
 	"strconv"
 
@@ -51,6 +50,9 @@ type FilesystemType struct{}
 type InternalData struct {
 	// ProductName is the value to be set to devices/virtual/dmi/id/product_name.
 	ProductName string
+
+	// Cgroup, if not nil, contains the resource limits presented in fs/cgroup.
+	Cgroup *CgroupLimits
 }
 
 // filesystem implements vfs.FilesystemImpl.
@@ -94,6 +96,11 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	fs.MaxCachedDentries = maxCachedDentries
 	fs.VFSFilesystem().Init(vfsObj, &fsType, fs)
 
+	var data InternalData
+	if opts.InternalData != nil {
+		data = *opts.InternalData.(*InternalData)
+	}
+
 	k := kernel.KernelFromContext(ctx)
 	fsDirChildren := make(map[string]kernfs.Inode)
 	// Create an empty directory to serve as the mount point for cgroupfs when
@@ -102,8 +109,17 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	// the init process) is ultimately responsible for actually mounting
 	// cgroupfs, but the kernel creates the mountpoint. For the sentry, the
 	// launcher mounts cgroupfs.
+	//
+	// If the launcher doesn't mount cgroupfs, the mountpoint instead contains a
+	// read-only cgroup v2 view of the container's resource limits, if any.
 	if k.CgroupRegistry() != nil {
-		fsDirChildren["cgroup"] = fs.newDir(ctx, creds, defaultSysDirMode, nil)
+		fsDirChildren["cgroup"] = cgroupDir(ctx, fs, creds, data.Cgroup)
+	}
+	// Similarly, create the mountpoint for fusectl.
+	if kernel.FUSEEnabled {
+		fsDirChildren["fuse"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"connections": fs.newDir(ctx, creds, defaultSysDirMode, nil),
+		})
 	}
 
 	classSub := map[string]kernfs.Inode{
@@ -111,14 +127,11 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	}
 	devicesSub := map[string]kernfs.Inode{
 		"system": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
-			"cpu": cpuDir(ctx, fs, creds),
+			"cpu":  cpuDir(ctx, fs, creds),
+			"node": nodeDir(ctx, fs, creds),
 		}),
 	}
-	productName := ""
-	if opts.InternalData != nil {
-		data := opts.InternalData.(*InternalData)
-		productName = data.ProductName
-	}
+	productName := data.ProductName
 	if len(productName) > 0 {
 		log.Debugf("Setting product_name: %q", productName)
 		classSub["dmi"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
@@ -149,20 +162,6 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	return fs.VFSFilesystem(), rootD.VFSDentry(), nil
 }
 
-func cpuDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) kernfs.Inode {
-	k := kernel.KernelFromContext(ctx)
-	maxCPUCores := k.ApplicationCores()
-	children := map[string]kernfs.Inode{
-		"online":   fs.newCPUFile(ctx, creds, maxCPUCores, linux.FileMode(0444)),
-		"possible": fs.newCPUFile(ctx, creds, maxCPUCores, linux.FileMode(0444)),
-		"present":  fs.newCPUFile(ctx, creds, maxCPUCores, linux.FileMode(0444)),
-	}
-	for i := uint(0); i < maxCPUCores; i++ {
-		children[fmt.Sprintf("cpu%d", i)] = fs.newDir(ctx, creds, linux.FileMode(0555), nil)
-	}
-	return fs.newDir(ctx, creds, defaultSysDirMode, children)
-}
-
 func kernelDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) kernfs.Inode {
 	// Set up /sys/kernel/debug/kcov. Technically, debugfs should be
 	// mounted at debug/, but for our purposes, it is sufficient to keep it
@@ -241,28 +240,6 @@ func (d *dir) StatFS(ctx context.Context, fs *vfs.Filesystem) (linux.Statfs, err
 	return vfs.GenericStatFS(linux.SYSFS_MAGIC), nil
 }
 
-// cpuFile implements kernfs.Inode.
-//
-// +stateify savable
-type cpuFile struct {
-	implStatFS
-	kernfs.DynamicBytesFile
-
-	maxCores uint
-}
-
-// Generate implements vfs.DynamicBytesSource.Generate.
-func (c *cpuFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	fmt.Fprintf(buf, "0-%d\n", c.maxCores-1)
-	return nil
-}
-
-func (fs *filesystem) newCPUFile(ctx context.Context, creds *auth.Credentials, maxCores uint, mode linux.FileMode) kernfs.Inode {
-	c := &cpuFile{maxCores: maxCores}
-	c.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), c, mode)
-	return c
-}
-
 // +stateify savable
 type implStatFS struct{}
 
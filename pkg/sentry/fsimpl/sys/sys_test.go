@@ -16,6 +16,7 @@ package sys_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -28,6 +29,10 @@ import (
 )
 
 func newTestSystem(t *testing.T) *testutil.System {
+	return newTestSystemWithData(t, nil)
+}
+
+func newTestSystemWithData(t *testing.T, data *sys.InternalData) *testutil.System {
 	k, err := testutil.Boot()
 	if err != nil {
 		t.Fatalf("Failed to create test kernel: %v", err)
@@ -38,7 +43,11 @@ func newTestSystem(t *testing.T) *testutil.System {
 		AllowUserMount: true,
 	})
 
-	mns, err := k.VFS().NewMountNamespace(ctx, creds, "", sys.Name, &vfs.MountOptions{})
+	opts := &vfs.MountOptions{}
+	if data != nil {
+		opts.GetFilesystemOptions.InternalData = data
+	}
+	mns, err := k.VFS().NewMountNamespace(ctx, creds, "", sys.Name, opts)
 	if err != nil {
 		t.Fatalf("Failed to create new mount namespace: %v", err)
 	}
@@ -70,6 +79,113 @@ func TestReadCPUFile(t *testing.T) {
 	}
 }
 
+func readFile(t *testing.T, s *testutil.System, path string) string {
+	t.Helper()
+	pop := s.PathOpAtRoot(path)
+	fd, err := s.VFS.OpenAt(s.Ctx, s.Creds, pop, &vfs.OpenOptions{})
+	if err != nil {
+		t.Fatalf("OpenAt(pop:%+v) failed: %v", pop, err)
+	}
+	defer fd.DecRef(s.Ctx)
+	content, err := s.ReadToEnd(fd)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	return content
+}
+
+func TestCPUTopology(t *testing.T) {
+	s := newTestSystem(t)
+	defer s.Destroy()
+	k := kernel.KernelFromContext(s.Ctx)
+	maxCPUCores := k.ApplicationCores()
+
+	all := fmt.Sprintf("0-%d\n", maxCPUCores-1)
+	for i := uint(0); i < maxCPUCores; i++ {
+		dir := fmt.Sprintf("devices/system/cpu/cpu%d/topology/", i)
+		for fname, want := range map[string]string{
+			"core_id":              fmt.Sprintf("%d\n", i),
+			"physical_package_id":  "0\n",
+			"core_siblings_list":   all,
+			"thread_siblings_list": fmt.Sprintf("%d\n", i),
+		} {
+			if diff := cmp.Diff(want, readFile(t, s, dir+fname)); diff != "" {
+				t.Errorf("Read %s returned unexpected data:\n--- want\n+++ got\n%v", dir+fname, diff)
+			}
+		}
+	}
+	// cpu0 is the least significant bit of the mask.
+	if got := readFile(t, s, "devices/system/cpu/cpu0/topology/thread_siblings"); !strings.HasSuffix(got, "1\n") {
+		t.Errorf("Read cpu0 thread_siblings = %q, want mask of cpu0", got)
+	}
+}
+
+func TestNUMANodes(t *testing.T) {
+	s := newTestSystem(t)
+	defer s.Destroy()
+	k := kernel.KernelFromContext(s.Ctx)
+	maxCPUCores := k.ApplicationCores()
+
+	// Without a synthetic topology, there is a single node with all CPUs.
+	cpus := fmt.Sprintf("0-%d\n", maxCPUCores-1)
+	if maxCPUCores == 1 {
+		cpus = "0\n"
+	}
+	for fname, want := range map[string]string{
+		"online":         "0\n",
+		"possible":       "0\n",
+		"has_cpu":        "0\n",
+		"has_memory":     "0\n",
+		"node0/cpulist":  cpus,
+		"node0/distance": "10\n",
+	} {
+		path := "devices/system/node/" + fname
+		if diff := cmp.Diff(want, readFile(t, s, path)); diff != "" {
+			t.Errorf("Read %s returned unexpected data:\n--- want\n+++ got\n%v", path, diff)
+		}
+	}
+	if got := readFile(t, s, "devices/system/node/node0/meminfo"); !strings.HasPrefix(got, "Node 0 MemTotal:") {
+		t.Errorf("Read node0/meminfo = %q, want prefix %q", got, "Node 0 MemTotal:")
+	}
+}
+
+func TestCgroupLimits(t *testing.T) {
+	s := newTestSystemWithData(t, &sys.InternalData{
+		Cgroup: &sys.CgroupLimits{
+			CPUQuota:    50000,
+			MemoryLimit: 1 << 30,
+		},
+	})
+	defer s.Destroy()
+	for fname, want := range map[string]string{
+		"cgroup.controllers": "cpu memory\n",
+		"cpu.max":            "50000 100000\n",
+		"memory.max":         "1073741824\n",
+	} {
+		if diff := cmp.Diff(want, readFile(t, s, "fs/cgroup/"+fname)); diff != "" {
+			t.Errorf("Read %s returned unexpected data:\n--- want\n+++ got\n%v", fname, diff)
+		}
+	}
+	if got := readFile(t, s, "fs/cgroup/memory.current"); got == "" {
+		t.Errorf("Read memory.current returned no data")
+	}
+}
+
+func TestCgroupUnlimited(t *testing.T) {
+	s := newTestSystemWithData(t, &sys.InternalData{
+		Cgroup: &sys.CgroupLimits{},
+	})
+	defer s.Destroy()
+	for fname, want := range map[string]string{
+		"cpu.max":    "max 100000\n",
+		"memory.max": "max\n",
+	} {
+		if diff := cmp.Diff(want, readFile(t, s, "fs/cgroup/"+fname)); diff != "" {
+			t.Errorf("Read %s returned unexpected data:\n--- want\n+++ got\n%v", fname, diff)
+		}
+	}
+}
+
 func TestSysRootContainsExpectedEntries(t *testing.T) {
 	s := newTestSystem(t)
 	defer s.Destroy()
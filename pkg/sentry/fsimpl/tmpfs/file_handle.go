@@ -0,0 +1,75 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpfs
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// fileHandleSize is the size of tmpfs file handles, which have type
+// linux.FILEID_INO64_GEN. Since tmpfs never reuses inode numbers, the
+// generation number is always 0.
+const fileHandleSize = 12
+
+// EncodeFileHandle implements vfs.FilesystemImplFileHandleExtension.EncodeFileHandle.
+func (fs *filesystem) EncodeFileHandle(ctx context.Context, vfsd *vfs.Dentry) (int32, []byte, error) {
+	d := vfsd.Impl().(*dentry)
+	ino := d.inode.ino
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// Files that are not reachable from the root (e.g. memfds) still have a
+	// handle, but it can never be decoded.
+	if !d.vfsd.IsDead() && (d == fs.root || d.parent != nil) {
+		if fs.fileHandles == nil {
+			fs.fileHandles = make(map[uint64]*dentry)
+		}
+		if _, ok := fs.fileHandles[ino]; !ok {
+			fs.fileHandles[ino] = d
+		}
+	}
+	b := make([]byte, fileHandleSize)
+	hostarch.ByteOrder.PutUint64(b, ino)
+	return linux.FILEID_INO64_GEN, b, nil
+}
+
+// DecodeFileHandle implements vfs.FilesystemImplFileHandleExtension.DecodeFileHandle.
+func (fs *filesystem) DecodeFileHandle(ctx context.Context, typ int32, b []byte) (*vfs.Dentry, error) {
+	if typ != linux.FILEID_INO64_GEN || len(b) != fileHandleSize || hostarch.ByteOrder.Uint32(b[8:]) != 0 {
+		return nil, linuxerr.ESTALE
+	}
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	d, ok := fs.fileHandles[hostarch.ByteOrder.Uint64(b)]
+	if !ok {
+		return nil, linuxerr.ESTALE
+	}
+	d.IncRef()
+	return &d.vfsd, nil
+}
+
+// forgetFileHandleLocked invalidates the file handle for d, which has been
+// unlinked. If d's inode has other links, encoding a handle for one of them
+// makes the handle valid again.
+//
+// Preconditions: fs.mu must be locked for writing.
+func (fs *filesystem) forgetFileHandleLocked(d *dentry) {
+	if fs.fileHandles[d.inode.ino] == d {
+		delete(fs.fileHandles, d.inode.ino)
+	}
+}
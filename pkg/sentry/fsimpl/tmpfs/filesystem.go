@@ -641,6 +641,7 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 	}
 	if replaced != nil {
 		newParentDir.removeChildLocked(replaced)
+		fs.forgetFileHandleLocked(replaced)
 		if replaced.inode.isDir() {
 			// Remove links for replaced/. and replaced/..
 			replaced.inode.decLinksLocked(ctx)
@@ -709,6 +710,7 @@ func (fs *filesystem) RmdirAt(ctx context.Context, rp *vfs.ResolvingPath) error
 		return err
 	}
 	parentDir.removeChildLocked(child)
+	fs.forgetFileHandleLocked(child)
 	parentDir.inode.watches.Notify(ctx, name, linux.IN_DELETE|linux.IN_ISDIR, 0, vfs.InodeEvent, true /* unlinked */)
 	// Remove links for child, child/., and child/..
 	child.inode.decLinksLocked(ctx)
@@ -824,6 +826,7 @@ func (fs *filesystem) UnlinkAt(ctx context.Context, rp *vfs.ResolvingPath) error
 	// before these events are added.
 	vfs.InotifyRemoveChild(ctx, &child.inode.watches, &parentDir.inode.watches, name)
 	parentDir.removeChildLocked(child)
+	fs.forgetFileHandleLocked(child)
 	child.inode.decLinksLocked(ctx)
 	vfsObj.CommitDeleteDentry(ctx, &child.vfsd)
 	parentDir.inode.touchCMtime()
@@ -946,6 +949,8 @@ func (fs *filesystem) PrependPath(ctx context.Context, vfsroot, vd vfs.VirtualDe
 
 // MountOptions implements vfs.FilesystemImpl.MountOptions.
 func (fs *filesystem) MountOptions() string {
+	fs.pagesUsedMu.Lock()
+	defer fs.pagesUsedMu.Unlock()
 	return fs.mopts
 }
 
@@ -967,18 +972,23 @@ func (fs *filesystem) checkFillAllocation(pagesReqd, pagesAlloced uint64) {
 // The returned value is guaranteed to be <= pagesInc. If the size mount option is
 // not set, then pagesInc will be returned.
 func (fs *filesystem) accountPagesPartial(pagesInc uint64) uint64 {
-	if fs.maxSizeInPages == 0 || pagesInc == 0 {
+	if fs.maxSizeInPages.Load() == 0 || pagesInc == 0 {
 		return pagesInc
 	}
 
 	// Need to acquire fs.pagesUsedMu for fs.pagesUsed.
 	fs.pagesUsedMu.Lock()
 	defer fs.pagesUsedMu.Unlock()
-	if fs.maxSizeInPages <= fs.pagesUsed {
+	maxSizeInPages := fs.maxSizeInPages.Load()
+	if maxSizeInPages == 0 {
+		// Raced with a remount that removed the size limit.
+		return pagesInc
+	}
+	if maxSizeInPages <= fs.pagesUsed {
 		return 0
 	}
 
-	pagesFree := fs.maxSizeInPages - fs.pagesUsed
+	pagesFree := maxSizeInPages - fs.pagesUsed
 	if pagesFree < pagesInc {
 		fs.pagesUsed += pagesFree
 		return pagesFree
@@ -992,18 +1002,23 @@ func (fs *filesystem) accountPagesPartial(pagesInc uint64) uint64 {
 // is mounted with size option. We return a false when the maxSizeInPages
 // has been exhausted and no more allocation can be done.
 func (fs *filesystem) accountPages(pagesInc uint64) bool {
-	if fs.maxSizeInPages == 0 || pagesInc == 0 {
+	if fs.maxSizeInPages.Load() == 0 || pagesInc == 0 {
 		return true // No accounting needed.
 	}
 
 	// Need to acquire fs.pagesUsedMu for fs.pagesUsed.
 	fs.pagesUsedMu.Lock()
 	defer fs.pagesUsedMu.Unlock()
-	if fs.maxSizeInPages <= fs.pagesUsed {
+	maxSizeInPages := fs.maxSizeInPages.Load()
+	if maxSizeInPages == 0 {
+		// Raced with a remount that removed the size limit.
+		return true
+	}
+	if maxSizeInPages <= fs.pagesUsed {
 		return false
 	}
 
-	pagesFree := fs.maxSizeInPages - fs.pagesUsed
+	pagesFree := maxSizeInPages - fs.pagesUsed
 	if pagesFree < pagesInc {
 		return false
 	}
@@ -1015,7 +1030,7 @@ func (fs *filesystem) accountPages(pagesInc uint64) bool {
 // unaccountPages decreases the pagesUsed in filesystem struct if tmpfs
 // is mounted with size option.
 func (fs *filesystem) unaccountPages(pagesDec uint64) {
-	if fs.maxSizeInPages == 0 || pagesDec == 0 {
+	if fs.maxSizeInPages.Load() == 0 || pagesDec == 0 {
 		return
 	}
 	// Need to acquire fs.pagesUsedMu for fs.pagesUsed.
@@ -18,12 +18,14 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/safemem"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
@@ -50,6 +52,13 @@ type regularFile struct {
 	// this regularFile's contents are accounted.
 	memoryUsageKind usage.MemoryKind
 
+	// secret is true if this file was created by memfd_secret(2). The
+	// contents of a secret file may only be accessed through shared memory
+	// mappings, and are not saved by save/restore.
+	//
+	// secret is immutable.
+	secret bool
+
 	// mapsMu protects mappings.
 	mapsMu sync.Mutex `state:"nosave"`
 
@@ -78,6 +87,13 @@ type regularFile struct {
 	// Protected by dataMu.
 	data fsutil.FileRangeSet
 
+	// dataPages is the number of pages mapped by data.
+	//
+	// Writing it requires holding dataMu for writing. Readers that do not
+	// require consistency (like Stat) may read the value atomically without
+	// holding dataMu.
+	dataPages atomicbitops.Uint64
+
 	// seals represents file seals on this inode.
 	//
 	// Protected by dataMu.
@@ -90,6 +106,14 @@ type regularFile struct {
 	// Readers that do not require consistency (like Stat) may read the
 	// value atomically without holding either lock.
 	size atomicbitops.Uint64
+
+	// lastUsed is the time, in nanoseconds since the Unix epoch, at which the
+	// file's data was last read, written, or translated. swapAged is 1 if the
+	// file's data has not been used since SwapOut invalidated mappings of it,
+	// and 0 otherwise. lastUsed and swapAged are only updated if memFile has
+	// a swap file.
+	lastUsed atomicbitops.Int64
+	swapAged atomicbitops.Uint32
 }
 
 func (fs *filesystem) newRegularFile(kuid auth.KUID, kgid auth.KGID, mode linux.FileMode, parentDir *directory) *inode {
@@ -100,6 +124,7 @@ func (fs *filesystem) newRegularFile(kuid auth.KUID, kgid auth.KGID, mode linux.
 	}
 	file.inode.init(file, fs, kuid, kgid, linux.S_IFREG|mode, parentDir)
 	file.inode.nlink = atomicbitops.FromUint32(1) // from parent directory
+	file.memFile.MarkSwappable(file)
 	return &file.inode
 }
 
@@ -163,6 +188,22 @@ func NewMemfd(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount, al
 	return &fd.vfsfd, nil
 }
 
+// NewMemfdSecret creates a new regular file and file description as for
+// memfd_secret.
+//
+// Preconditions: mount must be a tmpfs mount.
+func NewMemfdSecret(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount) (*vfs.FileDescription, error) {
+	// Compare mm/secretmem.c:secretmem_file_create().
+	fd, err := newUnlinkedRegularFileDescription(ctx, creds, mount, "secretmem")
+	if err != nil {
+		return nil, err
+	}
+	rf := fd.inode().impl.(*regularFile)
+	rf.memoryUsageKind = usage.Anonymous
+	rf.secret = true
+	return &fd.vfsfd, nil
+}
+
 // truncate grows or shrinks the file to the given size. It returns true if the
 // file size was updated.
 func (rf *regularFile) truncate(newSize uint64) (bool, error) {
@@ -226,6 +267,7 @@ func (rf *regularFile) truncateLocked(newSize uint64) (bool, error) {
 	// and can remove them.
 	rf.dataMu.Lock()
 	decPages := rf.data.Truncate(newSize, rf.memFile)
+	rf.dataPages.Add(^(decPages - 1))
 	rf.dataMu.Unlock()
 	rf.inode.fs.unaccountPages(decPages)
 	return true, nil
@@ -286,6 +328,7 @@ func (rf *regularFile) CopyMapping(ctx context.Context, ms memmap.MappingSpace,
 func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
 	rf.dataMu.Lock()
 	defer rf.dataMu.Unlock()
+	rf.markUsed()
 
 	// Constrain translations to f.attr.Size (rounded up) to prevent
 	// translation to pages that may be concurrently truncated.
@@ -302,7 +345,7 @@ func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.
 		optional.End = pgend
 	}
 	var pagesReqd uint64
-	if rf.inode.fs.maxSizeInPages > 0 {
+	if rf.inode.fs.maxSizeInPages.Load() > 0 {
 		pagesReqd = rf.data.PagesToFill(required, optional)
 		if !rf.inode.fs.accountPages(pagesReqd) {
 			// If we can not accommodate pagesReqd pages, then retry with just
@@ -319,8 +362,9 @@ func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.
 		// Newly-allocated pages are zeroed, so we don't need to do anything.
 		return dsts.NumBytes(), nil
 	})
+	rf.dataPages.Add(pagesAlloced)
 
-	if rf.inode.fs.maxSizeInPages > 0 {
+	if rf.inode.fs.maxSizeInPages.Load() > 0 {
 		rf.inode.fs.checkFillAllocation(pagesReqd, pagesAlloced)
 	}
 
@@ -328,6 +372,9 @@ func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.
 	var translatedEnd uint64
 	for seg := rf.data.FindSegment(required.Start); seg.Ok() && seg.Start() < required.End; seg, _ = seg.NextNonEmpty() {
 		segMR := seg.Range().Intersect(optional)
+		if rf.secret {
+			rf.memFile.MarkUnsavable(seg.FileRangeOf(segMR))
+		}
 		ts = append(ts, memmap.Translation{
 			Source: segMR,
 			File:   rf.memFile,
@@ -353,6 +400,76 @@ func (*regularFile) InvalidateUnsavable(context.Context) error {
 	return nil
 }
 
+// CacheStat implements memmap.CachedMappable.CacheStat. All of a tmpfs file's
+// data is cached, and is never dirty since there's nowhere to write it back
+// to.
+func (rf *regularFile) CacheStat(mr memmap.MappableRange) memmap.CacheStat {
+	rf.dataMu.RLock()
+	defer rf.dataMu.RUnlock()
+	return memmap.CacheStat{
+		Cache: rf.data.SpanRange(mr) / hostarch.PageSize,
+	}
+}
+
+// CachedRanges implements memmap.CachedMappable.CachedRanges.
+func (rf *regularFile) CachedRanges(mr memmap.MappableRange, fn func(memmap.MappableRange)) {
+	rf.dataMu.RLock()
+	defer rf.dataMu.RUnlock()
+	rf.data.ForEachRange(mr, fn)
+}
+
+// SwapOut implements pgalloc.SwappableMemoryUser.SwapOut.
+//
+// The file's data is swapped out in two steps: mappings of the file are first
+// invalidated, so that its next use by a MappingSpace is observed by
+// Translate; if the data is still unused by the next call to SwapOut, it is
+// swapped out. Pages of secret files are never swapped out, since they are
+// marked unsavable by Translate.
+func (rf *regularFile) SwapOut(ctx context.Context, length uint64) uint64 {
+	if rf.swapAged.Load() == 0 {
+		if pgend := fs.OffsetPageEnd(int64(rf.size.Load())); pgend != 0 {
+			rf.mapsMu.Lock()
+			rf.mappings.Invalidate(memmap.MappableRange{0, pgend}, memmap.InvalidateOpts{})
+			rf.mapsMu.Unlock()
+		}
+		rf.swapAged.Store(1)
+		return 0
+	}
+
+	rf.dataMu.Lock()
+	defer rf.dataMu.Unlock()
+	if rf.swapAged.Load() == 0 {
+		// Used since the check above.
+		return 0
+	}
+	var done uint64
+	for seg := rf.data.FirstSegment(); seg.Ok() && done < length; seg = seg.NextSegment() {
+		// Pages that have been translated since they were aged are still
+		// referenced by their mappings, and are skipped by
+		// MemoryFile.SwapOut.
+		n, err := rf.memFile.SwapOut(seg.FileRange(), length-done)
+		done += n
+		if err != nil {
+			log.Warningf("Failed to swap out tmpfs file data %v: %v", seg.Range(), err)
+			break
+		}
+	}
+	return done
+}
+
+// LastUsed implements pgalloc.SwappableMemoryUser.LastUsed.
+func (rf *regularFile) LastUsed() int64 {
+	return rf.lastUsed.Load()
+}
+
+// markUsed records that the file's data is being used.
+func (rf *regularFile) markUsed() {
+	if rf.memFile.SwapEnabled() {
+		rf.lastUsed.Store(time.Now().UnixNano())
+		rf.swapAged.Store(0)
+	}
+}
+
 // +stateify savable
 type regularFileFD struct {
 	fileDescription
@@ -371,15 +488,43 @@ func (fd *regularFileFD) Release(context.Context) {
 // Allocate implements vfs.FileDescriptionImpl.Allocate.
 func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
 	f := fd.inode().impl.(*regularFile)
+	if f.secret {
+		return linuxerr.EOPNOTSUPP
+	}
 
 	f.inode.mu.Lock()
 	defer f.inode.mu.Unlock()
-	f.dataMu.Lock()
-	defer f.dataMu.Unlock()
+
+	switch {
+	case mode&linux.FALLOC_FL_PUNCH_HOLE != 0:
+		// fallocate(2) ensures that FALLOC_FL_KEEP_SIZE is also set.
+		return f.punchHoleLocked(offset, length)
+	case mode&linux.FALLOC_FL_ZERO_RANGE != 0:
+		// Like filesystems that implement FALLOC_FL_ZERO_RANGE by
+		// allocating unwritten extents, deallocate the range and then
+		// allocate zeroed pages in its place.
+		if err := f.punchHoleLocked(offset, length); err != nil {
+			return err
+		}
+	case mode&^linux.FALLOC_FL_KEEP_SIZE != 0:
+		// Compare Linux's mm/shmem.c:shmem_fallocate().
+		return linuxerr.EOPNOTSUPP
+	}
+	return f.allocateLocked(ctx, offset, length, mode&linux.FALLOC_FL_KEEP_SIZE != 0)
+}
+
+// allocateLocked ensures that pages in the range specified by offset and
+// length are allocated, growing the file to offset+length unless keepSize is
+// true.
+//
+// Preconditions: rf.inode.mu must be held.
+func (rf *regularFile) allocateLocked(ctx context.Context, offset, length uint64, keepSize bool) error {
+	rf.dataMu.Lock()
+	defer rf.dataMu.Unlock()
 
 	// We must allocate pages in the range specified by offset and length.
 	// Even if newSize <= oldSize, there might not be actual memory backing this
-	// range, so any gaps must be filled by calling f.data.Fill().
+	// range, so any gaps must be filled by calling rf.data.Fill().
 	// "After a successful call, subsequent writes into the range
 	// specified by offset and len are guaranteed not to fail because of
 	// lack of disk space."  - fallocate(2)
@@ -391,35 +536,74 @@ func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint
 	}
 	required := memmap.MappableRange{Start: uint64(pgstartaddr), End: uint64(pgendaddr)}
 	var pagesReqd uint64
-	if f.inode.fs.maxSizeInPages > 0 {
-		pagesReqd = f.data.PagesToFill(required, required)
-		if !f.inode.fs.accountPages(pagesReqd) {
+	if rf.inode.fs.maxSizeInPages.Load() > 0 {
+		pagesReqd = rf.data.PagesToFill(required, required)
+		if !rf.inode.fs.accountPages(pagesReqd) {
 			return linuxerr.ENOSPC
 		}
 	}
 	// Pass populate = true here despite the fact that we don't touch these pages
 	// both for consistency with the expected behavior of fallocate(2) and in
 	// expectation of a future write to them.
-	pagesAlloced, err := f.data.Fill(ctx, required, required, newSize, f.memFile, f.memoryUsageKind, true /* populate */, func(_ context.Context, dsts safemem.BlockSeq, _ uint64) (uint64, error) {
+	pagesAlloced, err := rf.data.Fill(ctx, required, required, newSize, rf.memFile, rf.memoryUsageKind, true /* populate */, func(_ context.Context, dsts safemem.BlockSeq, _ uint64) (uint64, error) {
 		// Newly-allocated pages are zeroed, so we don't need to do anything.
 		return dsts.NumBytes(), nil
 	})
+	rf.dataPages.Add(pagesAlloced)
 	if err != nil && err != io.EOF {
-		if f.inode.fs.maxSizeInPages > 0 {
-			f.inode.fs.unaccountPages(pagesReqd)
+		if rf.inode.fs.maxSizeInPages.Load() > 0 {
+			rf.inode.fs.unaccountPages(pagesReqd)
 		}
 		return err
 	}
 
-	if f.inode.fs.maxSizeInPages > 0 {
-		f.inode.fs.checkFillAllocation(pagesReqd, pagesAlloced)
+	if rf.inode.fs.maxSizeInPages.Load() > 0 {
+		rf.inode.fs.checkFillAllocation(pagesReqd, pagesAlloced)
 	}
 
-	oldSize := f.size.Load()
-	if oldSize >= newSize {
+	oldSize := rf.size.Load()
+	if keepSize || oldSize >= newSize {
 		return nil
 	}
-	return f.growLocked(newSize)
+	return rf.growLocked(newSize)
+}
+
+// punchHoleLocked deallocates the range specified by offset and length, which
+// subsequently reads as zeroes. The file's size is unchanged.
+//
+// Preconditions: rf.inode.mu must be held.
+func (rf *regularFile) punchHoleLocked(offset, length uint64) error {
+	rf.dataMu.Lock()
+	// Compare Linux's mm/shmem.c:shmem_fallocate().
+	if rf.seals&linux.F_SEAL_WRITE != 0 {
+		rf.dataMu.Unlock()
+		return linuxerr.EPERM
+	}
+	end := offset + length
+	if size := rf.size.RacyLoad(); end > size {
+		// Pages beyond EOF can only have been allocated by a previous
+		// fallocate(FALLOC_FL_KEEP_SIZE), and are deallocated along with
+		// the rest of the range.
+		if pgend, ok := hostarch.PageRoundUp(end); ok {
+			end = pgend
+		}
+	}
+	freed, decPages := rf.data.Punch(memmap.MappableRange{offset, end}, rf.memFile)
+	rf.dataPages.Add(^(decPages - 1))
+	rf.dataMu.Unlock()
+	rf.inode.fs.unaccountPages(decPages)
+
+	// Invalidate translations of freed pages, so that subsequent accesses
+	// fault in zeroed pages. Bytes zeroed in partially-covered pages are
+	// visible through existing translations. Compare Linux's
+	// mm/shmem.c:shmem_fallocate() => mm/memory.c:unmap_mapping_range(
+	// evencows=0).
+	if freed.Length() != 0 {
+		rf.mapsMu.Lock()
+		rf.mappings.Invalidate(freed, memmap.InvalidateOpts{})
+		rf.mapsMu.Unlock()
+	}
+	return nil
 }
 
 // PRead implements vfs.FileDescriptionImpl.PRead.
@@ -428,29 +612,36 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 	defer fsmetric.FinishReadWait(fsmetric.TmpfsReadWait, start)
 	fsmetric.TmpfsReads.Increment()
 
-	if offset < 0 {
+	if offset < 0 || fd.inode().impl.(*regularFile).secret {
 		return 0, linuxerr.EINVAL
 	}
 
 	// Check that flags are supported. RWF_DSYNC/RWF_SYNC can be ignored since
-	// all state is in-memory.
-	//
-	// TODO(gvisor.dev/issue/2601): Support select preadv2 flags.
-	if opts.Flags&^(linux.RWF_HIPRI|linux.RWF_DSYNC|linux.RWF_SYNC) != 0 {
+	// all state is in-memory, and so can RWF_NOWAIT since reads never block.
+	if opts.Flags&^(linux.RWF_HIPRI|linux.RWF_DSYNC|linux.RWF_SYNC|linux.RWF_NOWAIT) != 0 {
 		return 0, linuxerr.EOPNOTSUPP
 	}
 
 	if dst.NumBytes() == 0 {
 		return 0, nil
 	}
+	if opts.Flags&linux.RWF_NOWAIT == 0 {
+		usage.ThrottleIO(ctx, false /* write */, dst.NumBytes())
+	}
 	f := fd.inode().impl.(*regularFile)
 	rw := getRegularFileReadWriter(f, offset)
 	n, err := dst.CopyOutFrom(ctx, rw)
 	putRegularFileReadWriter(rw)
+	usage.AccountIO(ctx, usage.IOSourceTmpfs, false /* write */, n)
 	fd.inode().touchAtime(fd.vfsfd.Mount())
 	return n, err
 }
 
+// CacheStat implements vfs.FileDescriptionImplCacheStatExtension.CacheStat.
+func (fd *regularFileFD) CacheStat(ctx context.Context, mr memmap.MappableRange) (memmap.CacheStat, error) {
+	return fd.inode().impl.(*regularFile).CacheStat(mr), nil
+}
+
 // Read implements vfs.FileDescriptionImpl.Read.
 func (fd *regularFileFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
 	fd.offMu.Lock()
@@ -469,7 +660,7 @@ func (fd *regularFileFD) PWrite(ctx context.Context, src usermem.IOSequence, off
 // pwrite returns the number of bytes written, final offset and error. The
 // final offset should be ignored by PWrite.
 func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (written, finalOff int64, err error) {
-	if offset < 0 {
+	if offset < 0 || fd.inode().impl.(*regularFile).secret {
 		return 0, offset, linuxerr.EINVAL
 	}
 
@@ -485,6 +676,7 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 	if srclen == 0 {
 		return 0, offset, nil
 	}
+	usage.ThrottleIO(ctx, true /* write */, srclen)
 	f := fd.inode().impl.(*regularFile)
 	f.inode.mu.Lock()
 	defer f.inode.mu.Unlock()
@@ -508,6 +700,7 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 	// Perform the write.
 	rw := getRegularFileReadWriter(f, offset)
 	n, err := src.CopyInTo(ctx, rw)
+	usage.AccountIO(ctx, usage.IOSourceTmpfs, true /* write */, n)
 
 	f.inode.touchCMtimeLocked()
 	for {
@@ -541,6 +734,15 @@ func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (
 		offset += fd.off
 	case linux.SEEK_END:
 		offset += int64(fd.inode().impl.(*regularFile).size.Load())
+	case linux.SEEK_DATA, linux.SEEK_HOLE:
+		if offset < 0 {
+			return 0, linuxerr.ENXIO
+		}
+		off, err := fd.inode().impl.(*regularFile).seekDataOrHole(uint64(offset), whence)
+		if err != nil {
+			return 0, err
+		}
+		offset = int64(off)
 	default:
 		return 0, linuxerr.EINVAL
 	}
@@ -551,9 +753,47 @@ func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (
 	return offset, nil
 }
 
+// seekDataOrHole returns the result of lseek(SEEK_DATA) or lseek(SEEK_HOLE),
+// as specified by whence, starting from offset. Pages that are not allocated
+// are holes; compare Linux's mm/shmem.c:shmem_file_llseek().
+func (rf *regularFile) seekDataOrHole(offset uint64, whence int32) (uint64, error) {
+	rf.dataMu.RLock()
+	defer rf.dataMu.RUnlock()
+	size := rf.size.RacyLoad()
+	if offset >= size {
+		return 0, linuxerr.ENXIO
+	}
+	seg, gap := rf.data.Find(offset)
+	if whence == linux.SEEK_DATA {
+		if seg.Ok() {
+			return offset, nil
+		}
+		if seg = gap.NextSegment(); !seg.Ok() || seg.Start() >= size {
+			return 0, linuxerr.ENXIO
+		}
+		return seg.Start(), nil
+	}
+	if gap.Ok() {
+		return offset, nil
+	}
+	for gap = seg.NextGap(); gap.Ok() && gap.Range().Length() == 0; gap = gap.NextSegment().NextGap() {
+	}
+	if !gap.Ok() || gap.Start() >= size {
+		return size, nil
+	}
+	return gap.Start(), nil
+}
+
 // ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
 func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
 	file := fd.inode().impl.(*regularFile)
+	if file.secret {
+		// Compare mm/secretmem.c:secretmem_mmap().
+		if opts.Private {
+			return linuxerr.EINVAL
+		}
+		opts.Secret = true
+	}
 	opts.SentryOwnedContent = true
 	return vfs.GenericConfigureMMap(&fd.vfsfd, file, opts)
 }
@@ -589,6 +829,7 @@ func putRegularFileReadWriter(rw *regularFileReadWriter) {
 func (rw *regularFileReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error) {
 	rw.file.dataMu.RLock()
 	defer rw.file.dataMu.RUnlock()
+	rw.file.markUsed()
 	size := rw.file.size.RacyLoad()
 
 	// Compute the range to read (limited by file size and overflow-checked).
@@ -650,6 +891,7 @@ func (rw *regularFileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64,
 	// Hold dataMu so we can modify size.
 	rw.file.dataMu.Lock()
 	defer rw.file.dataMu.Unlock()
+	rw.file.markUsed()
 
 	// Compute the range to write (overflow-checked).
 	end := rw.off + srcs.NumBytes()
@@ -743,6 +985,7 @@ func (rw *regularFileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64,
 
 			// Write to that memory as usual.
 			seg, gap = rw.file.data.Insert(gap, gapMR, fr.Start), fsutil.FileRangeGapIterator{}
+			rw.file.dataPages.Add(pagesAlloced)
 		default:
 			panic("unreachable")
 		}
@@ -72,7 +72,7 @@ type filesystem struct {
 	devMinor uint32
 
 	// mopts contains the tmpfs-specific mount options passed to this
-	// filesystem. Immutable.
+	// filesystem. mopts is protected by pagesUsedMu.
 	mopts string
 
 	// usage is the memory accounting category under which pages backing
@@ -86,11 +86,18 @@ type filesystem struct {
 
 	root *dentry
 
+	// fileHandles maps the inode numbers encoded in file handles to the
+	// dentries they were obtained through. A dentry is removed from
+	// fileHandles when it is unlinked, so that decoding its handle fails with
+	// ESTALE. fileHandles is protected by mu.
+	fileHandles map[uint64]*dentry
+
 	maxFilenameLen int
 
-	// maxSizeInPages is the maximum permissible size for the tmpfs in terms of pages.
-	// This field is immutable.
-	maxSizeInPages uint64
+	// maxSizeInPages is the maximum permissible size for the tmpfs in terms of
+	// pages, or 0 if the size is unlimited. maxSizeInPages may be changed by
+	// remounting the filesystem; this requires holding pagesUsedMu.
+	maxSizeInPages atomicbitops.Uint64
 
 	// pagesUsed is the pages used out of the tmpfs size.
 	// pagesUsed is protected by pagesUsedMu.
@@ -236,7 +243,7 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		mopts:          opts.Data,
 		usage:          memUsage,
 		maxFilenameLen: linux.NAME_MAX,
-		maxSizeInPages: maxSizeInPages,
+		maxSizeInPages: atomicbitops.FromUint64(maxSizeInPages),
 	}
 	fs.vfsfs.Init(vfsObj, newFSType, &fs)
 	if tmpfsOptsOk && tmpfsOpts.MaxFilenameLen > 0 {
@@ -259,6 +266,73 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	return &fs.vfsfs, &root.vfsd, nil
 }
 
+// Remount implements vfs.FilesystemImplRemountExtension.Remount.
+func (fs *filesystem) Remount(ctx context.Context, creds *auth.Credentials, data string) error {
+	// Compare mm/shmem.c:shmem_reconfigure().
+	mopts := vfs.GenericParseMountOptions(data)
+	// Linux accepts but ignores the root inode's attributes on remount.
+	delete(mopts, "mode")
+	delete(mopts, "uid")
+	delete(mopts, "gid")
+	maxSizeStr, haveSize := mopts["size"]
+	var maxSizeInPages uint64
+	if haveSize {
+		delete(mopts, "size")
+		maxSizeInBytes, err := parseSize(maxSizeStr)
+		if err != nil {
+			ctx.Debugf("tmpfs.filesystem.Remount: parseSize() failed: %v", err)
+			return linuxerr.EINVAL
+		}
+		var ok bool
+		maxSizeInPages, ok = hostarch.ToPages(maxSizeInBytes)
+		if !ok {
+			ctx.Warningf("tmpfs.filesystem.Remount: Pages RoundUp Overflow error: %q", ok)
+			return linuxerr.EINVAL
+		}
+	}
+	if len(mopts) != 0 {
+		ctx.Warningf("tmpfs.filesystem.Remount: unknown options: %v", mopts)
+		return linuxerr.EINVAL
+	}
+	if !haveSize {
+		return nil
+	}
+
+	fs.pagesUsedMu.Lock()
+	defer fs.pagesUsedMu.Unlock()
+	if maxSizeInPages != 0 {
+		// Page usage isn't tracked while the size is unlimited.
+		if fs.maxSizeInPages.Load() == 0 {
+			ctx.Debugf("tmpfs.filesystem.Remount: cannot retroactively limit size")
+			return linuxerr.EINVAL
+		}
+		if fs.pagesUsed > maxSizeInPages {
+			ctx.Debugf("tmpfs.filesystem.Remount: too small a size for current use: %d pages used, %d pages requested", fs.pagesUsed, maxSizeInPages)
+			return linuxerr.EINVAL
+		}
+	}
+	fs.maxSizeInPages.Store(maxSizeInPages)
+	fs.mopts = replaceMountOption(fs.mopts, "size", maxSizeStr)
+	return nil
+}
+
+// replaceMountOption returns mopts, a comma-separated list of mount options,
+// with the value of the option named key set to value.
+func replaceMountOption(mopts, key, value string) string {
+	var opts []string
+	if mopts != "" {
+		opts = strings.Split(mopts, ",")
+	}
+	opt := key + "=" + value
+	for i, o := range opts {
+		if o == key || strings.HasPrefix(o, key+"=") {
+			opts[i] = opt
+			return strings.Join(opts, ",")
+		}
+	}
+	return strings.Join(append(opts, opt), ",")
+}
+
 // NewFilesystem returns a new tmpfs filesystem.
 func NewFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials) (*vfs.Filesystem, *vfs.Dentry, error) {
 	return FilesystemType{}.GetFilesystem(ctx, vfsObj, creds, "", vfs.GetFilesystemOptions{})
@@ -311,13 +385,13 @@ func (fs *filesystem) statFS() linux.Statfs {
 	// tmpfs supports configurable size limits.
 	// In Linux, if tmpfs is mounted with size option,
 	// we return the block sizes as set by the user.
-	if fs.maxSizeInPages > 0 {
+	fs.pagesUsedMu.Lock()
+	defer fs.pagesUsedMu.Unlock()
+	if maxSizeInPages := fs.maxSizeInPages.Load(); maxSizeInPages > 0 {
 		// If size is set for tmpfs return set values.
-		st.Blocks = fs.maxSizeInPages
-		fs.pagesUsedMu.Lock()
-		defer fs.pagesUsedMu.Unlock()
-		st.BlocksFree = fs.maxSizeInPages - fs.pagesUsed
-		st.BlocksAvailable = fs.maxSizeInPages - fs.pagesUsed
+		st.Blocks = maxSizeInPages
+		st.BlocksFree = maxSizeInPages - fs.pagesUsed
+		st.BlocksAvailable = maxSizeInPages - fs.pagesUsed
 		return st
 	}
 	// In Linux, if tmpfs is mounted with no size option,
@@ -440,10 +514,10 @@ type inode struct {
 	gid   atomicbitops.Uint32 // auth.KGID, but ...
 	ino   uint64              // immutable
 
-	// Linux's tmpfs has no concept of btime.
 	atime atomicbitops.Int64 // nanoseconds
 	ctime atomicbitops.Int64 // nanoseconds
 	mtime atomicbitops.Int64 // nanoseconds
+	btime int64              // nanoseconds, immutable
 
 	locks vfs.FileLocks
 
@@ -473,11 +547,12 @@ func (i *inode) init(impl interface{}, fs *filesystem, kuid auth.KUID, kgid auth
 	i.uid = atomicbitops.FromUint32(uint32(kuid))
 	i.gid = atomicbitops.FromUint32(uint32(kgid))
 	i.ino = fs.nextInoMinusOne.Add(1)
-	// Tmpfs creation sets atime, ctime, and mtime to current time.
+	// Tmpfs creation sets atime, ctime, mtime, and btime to current time.
 	now := fs.clock.Now().Nanoseconds()
 	i.atime = atomicbitops.FromInt64(now)
 	i.ctime = atomicbitops.FromInt64(now)
 	i.mtime = atomicbitops.FromInt64(now)
+	i.btime = now
 	// i.nlink initialized by caller
 	i.impl = impl
 	i.refs.InitRefs()
@@ -537,6 +612,7 @@ func (i *inode) decRef(ctx context.Context) {
 			// Release memory used by regFile to store data. Since regFile is
 			// no longer usable, we don't need to grab any locks or update any
 			// metadata.
+			impl.memFile.MarkUnswappable(impl)
 			pagesDec := impl.data.DropAll(impl.memFile)
 			impl.inode.fs.unaccountPages(pagesDec)
 		}
@@ -559,7 +635,7 @@ func (i *inode) statTo(stat *linux.Statx) {
 	stat.Mask = linux.STATX_TYPE | linux.STATX_MODE | linux.STATX_NLINK |
 		linux.STATX_UID | linux.STATX_GID | linux.STATX_INO | linux.STATX_SIZE |
 		linux.STATX_BLOCKS | linux.STATX_ATIME | linux.STATX_CTIME |
-		linux.STATX_MTIME
+		linux.STATX_MTIME | linux.STATX_BTIME
 	stat.Blksize = hostarch.PageSize
 	stat.Nlink = i.nlink.Load()
 	stat.UID = i.uid.Load()
@@ -569,15 +645,14 @@ func (i *inode) statTo(stat *linux.Statx) {
 	stat.Atime = linux.NsecToStatxTimestamp(i.atime.Load())
 	stat.Ctime = linux.NsecToStatxTimestamp(i.ctime.Load())
 	stat.Mtime = linux.NsecToStatxTimestamp(i.mtime.Load())
+	stat.Btime = linux.NsecToStatxTimestamp(i.btime)
 	stat.DevMajor = linux.UNNAMED_MAJOR
 	stat.DevMinor = i.fs.devMinor
 	switch impl := i.impl.(type) {
 	case *regularFile:
 		stat.Mask |= linux.STATX_SIZE | linux.STATX_BLOCKS
 		stat.Size = uint64(impl.size.Load())
-		// TODO(jamieliu): This should be impl.data.Span() / 512, but this is
-		// too expensive to compute here. Cache it in regularFile.
-		stat.Blocks = allocatedBlocksForSize(stat.Size)
+		stat.Blocks = impl.dataPages.Load() * (hostarch.PageSize / 512)
 	case *directory:
 		stat.Size = direntSize * (2 + uint64(impl.numChildren.Load()))
 		// stat.Blocks is 0.
@@ -711,15 +786,6 @@ func (i *inode) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs.
 	return nil
 }
 
-// allocatedBlocksForSize returns the number of 512B blocks needed to
-// accommodate the given size in bytes, as appropriate for struct
-// stat::st_blocks and struct statx::stx_blocks. (Note that this 512B block
-// size is independent of the "preferred block size for I/O", struct
-// stat::st_blksize and struct statx::stx_blksize.)
-func allocatedBlocksForSize(size uint64) uint64 {
-	return (size + 511) / 512
-}
-
 func (i *inode) direntType() uint8 {
 	switch impl := i.impl.(type) {
 	case *regularFile:
@@ -752,7 +818,7 @@ func (i *inode) isDir() bool {
 }
 
 func (i *inode) touchAtime(mnt *vfs.Mount) {
-	if mnt.Flags.NoATime {
+	if mnt.Flags().NoATime {
 		return
 	}
 	if err := mnt.CheckBeginWrite(); err != nil {
@@ -795,8 +861,9 @@ func checkXattrName(name string) error {
 	// Linux's tmpfs supports "security" and "trusted" xattr namespaces, and
 	// (depending on build configuration) POSIX ACL xattr namespaces
 	// ("system.posix_acl_access" and "system.posix_acl_default"). We don't
-	// support POSIX ACLs or the "security" namespace (b/148380782).
-	if strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) {
+	// support POSIX ACLs or the "security" namespace (b/148380782), except
+	// for file capabilities.
+	if strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) || name == linux.XATTR_NAME_CAPS {
 		return nil
 	}
 	// We support the "user" namespace because we have tests that depend on
@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package kernel
+package inet
 
 import (
 	"fmt"
@@ -44,6 +44,10 @@ type AbstractSocketNamespace struct {
 	// destroyed. It is the responsibility of the socket to remove itself from the
 	// abstract socket namespace when it is destroyed.
 	endpoints map[string]abstractEndpoint
+
+	// hostNames is the set of names which, if no socket in the namespace is
+	// bound to them, are forwarded to the host's abstract socket namespace.
+	hostNames map[string]struct{}
 }
 
 // NewAbstractSocketNamespace returns a new AbstractSocketNamespace.
@@ -73,18 +77,30 @@ func (a *AbstractSocketNamespace) BoundEndpoint(name string) transport.BoundEndp
 	defer a.mu.Unlock()
 
 	ep, ok := a.endpoints[name]
-	if !ok {
-		return nil
-	}
-
-	if !ep.socket.TryIncRef() {
-		// The socket has reached zero references and is being destroyed.
+	if !ok || !ep.socket.TryIncRef() {
+		// Either no socket is bound, or it has reached zero references and
+		// is being destroyed.
+		if _, ok := a.hostNames[name]; ok {
+			return transport.NewHostAbstractEndpoint(name)
+		}
 		return nil
 	}
 
 	return &boundEndpoint{ep.ep, ep.socket}
 }
 
+// SetHostNames sets the names for which connections are forwarded to the
+// host's abstract socket namespace, unless a socket in a is bound to them.
+func (a *AbstractSocketNamespace) SetHostNames(names []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.hostNames = make(map[string]struct{}, len(names))
+	for _, name := range names {
+		a.hostNames[name] = struct{}{}
+	}
+}
+
 // Bind binds the given socket.
 //
 // When the last reference managed by socket is dropped, ep may be removed from the
@@ -16,6 +16,8 @@
 package inet
 
 import (
+	"time"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
@@ -31,6 +33,9 @@ type Stack interface {
 	// RemoveInterface removes the specified network interface.
 	RemoveInterface(idx int32) error
 
+	// SetInterfaceUp brings the specified network interface up or down.
+	SetInterfaceUp(idx int32, up bool) error
+
 	// InterfaceAddrs returns all network interface addresses as a mapping from
 	// interface indexes to a slice of associated interface address properties.
 	InterfaceAddrs() map[int32][]InterfaceAddr
@@ -73,12 +78,30 @@ type Stack interface {
 	// SetTCPRecovery attempts to change TCP loss detection algorithm.
 	SetTCPRecovery(recovery TCPLossRecovery) error
 
+	// TCPRetries2 returns the default maximum number of retransmissions of a
+	// segment before a TCP connection is aborted.
+	TCPRetries2() (uint32, error)
+
+	// SetTCPRetries2 attempts to change the default maximum number of TCP
+	// retransmissions.
+	SetTCPRetries2(retries uint32) error
+
 	// Statistics reports stack statistics.
 	Statistics(stat interface{}, arg string) error
 
 	// RouteTable returns the network stack's route table.
 	RouteTable() []Route
 
+	// AddRoute adds a route to the network stack's route table. flags are the
+	// NLM_F_* flags of the RTM_NEWROUTE request, which determine what happens
+	// if a route with the same destination and priority already exists.
+	AddRoute(route Route, flags uint16) error
+
+	// RemoveRoute removes the first route in the network stack's route table
+	// that matches route. Only the family, destination and non-zero
+	// OutputInterface, GatewayAddr and Priority of route are matched.
+	RemoveRoute(route Route) error
+
 	// Pause pauses the network stack before save.
 	Pause()
 
@@ -108,6 +131,24 @@ type Stack interface {
 	// SetPortRange sets the UDP and TCP IPv4 and IPv6 ephemeral port range
 	// (inclusive).
 	SetPortRange(start uint16, end uint16) error
+
+	// ConnTrackTimeouts returns the timeouts of connections tracked for NAT.
+	ConnTrackTimeouts() (stack.ConnTrackTimeouts, error)
+
+	// SetConnTrackTimeouts sets the timeouts of connections tracked for NAT.
+	// Existing connections adopt them when they next see a packet.
+	SetConnTrackTimeouts(timeouts stack.ConnTrackTimeouts) error
+
+	// ConnTrackMax returns the maximum number of connections tracked for
+	// NAT, or 0 if it is unlimited.
+	ConnTrackMax() (int, error)
+
+	// SetConnTrackMax sets the maximum number of connections tracked for
+	// NAT.
+	SetConnTrackMax(max int) error
+
+	// ConnTrackCount returns the number of connections tracked for NAT.
+	ConnTrackCount() (int, error)
 }
 
 // Interface contains information about a network interface.
@@ -141,11 +182,98 @@ type InterfaceAddr struct {
 	// PrefixLen is the address prefix length.
 	PrefixLen uint8
 
-	// Flags is the address flags.
+	// Flags is the address flags, a combination of Linux IFA_F_* constants.
 	Flags uint8
 
 	// Addr is the actual address.
 	Addr []byte
+
+	// PreferredLifetime is the remaining time until the address becomes
+	// deprecated. It is ignored if Flags includes IFA_F_DEPRECATED. Zero
+	// means that the address never becomes deprecated.
+	PreferredLifetime time.Duration
+
+	// ValidLifetime is the remaining time until the address is removed. Zero
+	// means that the address is never removed.
+	ValidLifetime time.Duration
+}
+
+// interfaceAddrAddedHandler is called by NotifyInterfaceAddrAdded.
+var interfaceAddrAddedHandler func(s Stack, idx int32, addr InterfaceAddr)
+
+// RegisterInterfaceAddrAddedHandler registers f to be called when an address
+// is added to a Stack by the sandbox rather than by the application.
+//
+// Preconditions: May only be called before any Stacks are created.
+func RegisterInterfaceAddrAddedHandler(f func(s Stack, idx int32, addr InterfaceAddr)) {
+	interfaceAddrAddedHandler = f
+}
+
+// NotifyInterfaceAddrAdded is called when addr is added to the interface with
+// index idx after the network namespace of s is in use, e.g. when an address
+// is leased by DHCP.
+func NotifyInterfaceAddrAdded(s Stack, idx int32, addr InterfaceAddr) {
+	if interfaceAddrAddedHandler != nil {
+		interfaceAddrAddedHandler(s, idx, addr)
+	}
+}
+
+// interfaceAddrRemovedHandler is called by NotifyInterfaceAddrRemoved.
+var interfaceAddrRemovedHandler func(s Stack, idx int32, addr InterfaceAddr)
+
+// RegisterInterfaceAddrRemovedHandler registers f to be called when an address
+// is removed from a Stack.
+//
+// Preconditions: May only be called before any Stacks are created.
+func RegisterInterfaceAddrRemovedHandler(f func(s Stack, idx int32, addr InterfaceAddr)) {
+	interfaceAddrRemovedHandler = f
+}
+
+// NotifyInterfaceAddrRemoved is called by Stack implementations when addr is
+// removed from the interface with index idx, whether explicitly or because
+// its lifetime expired or duplicate address detection failed. addr.Flags
+// describes the state of the address when it was removed.
+func NotifyInterfaceAddrRemoved(s Stack, idx int32, addr InterfaceAddr) {
+	if interfaceAddrRemovedHandler != nil {
+		interfaceAddrRemovedHandler(s, idx, addr)
+	}
+}
+
+// interfaceChangedHandler is called by NotifyInterfaceAdded and
+// NotifyInterfaceRemoved.
+var interfaceChangedHandler func(s Stack, idx int32, iface Interface, removed bool)
+
+// RegisterInterfaceChangedHandler registers f to be called when an interface
+// is added to, modified in or removed from a Stack.
+//
+// Preconditions: May only be called before any Stacks are created.
+func RegisterInterfaceChangedHandler(f func(s Stack, idx int32, iface Interface, removed bool)) {
+	interfaceChangedHandler = f
+}
+
+// NotifyInterfaceAdded is called when the interface iface with index idx is
+// added to s after the network namespace of s is in use, e.g. when a NIC is
+// hot-plugged into a running sandbox.
+func NotifyInterfaceAdded(s Stack, idx int32, iface Interface) {
+	if interfaceChangedHandler != nil {
+		interfaceChangedHandler(s, idx, iface, false /* removed */)
+	}
+}
+
+// NotifyInterfaceChanged is called when the flags of the interface iface with
+// index idx change. iface describes the interface after the change.
+func NotifyInterfaceChanged(s Stack, idx int32, iface Interface) {
+	if interfaceChangedHandler != nil {
+		interfaceChangedHandler(s, idx, iface, false /* removed */)
+	}
+}
+
+// NotifyInterfaceRemoved is called when the interface iface with index idx is
+// removed from s. iface describes the interface before it was removed.
+func NotifyInterfaceRemoved(s Stack, idx int32, iface Interface) {
+	if interfaceChangedHandler != nil {
+		interfaceChangedHandler(s, idx, iface, true /* removed */)
+	}
 }
 
 // TCPBufferSize contains settings controlling TCP buffer sizing.
@@ -206,6 +334,10 @@ type Route struct {
 
 	// GatewayAddr is the route gateway address (RTA_GATEWAY).
 	GatewayAddr []byte
+
+	// Priority is the route metric (RTA_PRIORITY). Lower values are
+	// preferred.
+	Priority uint32
 }
 
 // Below SNMP metrics are from Linux/usr/include/linux/snmp.h.
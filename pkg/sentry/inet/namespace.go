@@ -14,6 +14,11 @@
 
 package inet
 
+import (
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
 // Namespace represents a network namespace. See network_namespaces(7).
 //
 // +stateify savable
@@ -32,16 +37,45 @@ type Namespace struct {
 
 	// isRoot indicates whether this is the root network namespace.
 	isRoot bool
+
+	// abstractSockets tracks abstract sockets that are in use. Like on
+	// Linux, the abstract socket namespace is a property of the network
+	// namespace.
+	abstractSockets *AbstractSocketNamespace
+
+	// nftablesMu protects nftables.
+	nftablesMu sync.Mutex `state:"nosave"`
+
+	// nftables is the nftables ruleset of this network namespace. It is
+	// opaque to this package; see NFTables.
+	nftables interface{}
+
+	// pingGroupRangeMu protects pingGroupRange.
+	pingGroupRangeMu sync.Mutex `state:"nosave"`
+
+	// pingGroupRange is the inclusive range of groups whose members may
+	// create ICMP echo sockets, as in /proc/sys/net/ipv4/ping_group_range.
+	pingGroupRange [2]auth.KGID
 }
 
+// MaxPingGroup is the maximum group in ping_group_range, Linux's GID_T_MAX.
+const MaxPingGroup = auth.KGID(1<<31 - 1)
+
+// defaultPingGroupRange is the initial ping_group_range of network
+// namespaces. Unlike Linux, which disallows unprivileged ICMP echo sockets by
+// default, all groups may create them, which is also the default of systemd.
+var defaultPingGroupRange = [2]auth.KGID{0, MaxPingGroup}
+
 // NewRootNamespace creates the root network namespace, with creator
 // allowing new network namespaces to be created. If creator is nil, no
 // networking will function if the network is namespaced.
 func NewRootNamespace(stack Stack, creator NetworkStackCreator) *Namespace {
 	n := &Namespace{
-		stack:   stack,
-		creator: creator,
-		isRoot:  true,
+		stack:           stack,
+		creator:         creator,
+		isRoot:          true,
+		abstractSockets: NewAbstractSocketNamespace(),
+		pingGroupRange:  defaultPingGroupRange,
 	}
 	n.InitRefs()
 	return n
@@ -50,7 +84,9 @@ func NewRootNamespace(stack Stack, creator NetworkStackCreator) *Namespace {
 // NewNamespace creates a new network namespace from the root.
 func NewNamespace(root *Namespace) *Namespace {
 	n := &Namespace{
-		creator: root.creator,
+		creator:         root.creator,
+		abstractSockets: NewAbstractSocketNamespace(),
+		pingGroupRange:  defaultPingGroupRange,
 	}
 	n.init()
 	n.InitRefs()
@@ -72,6 +108,56 @@ func (n *Namespace) Stack() Stack {
 	return n.stack
 }
 
+// AbstractSockets returns the abstract socket namespace of n.
+func (n *Namespace) AbstractSockets() *AbstractSocketNamespace {
+	return n.abstractSockets
+}
+
+// NFTables returns the nftables ruleset of n. If n doesn't have one yet, it
+// is created by calling newRuleset.
+func (n *Namespace) NFTables(newRuleset func() interface{}) interface{} {
+	n.nftablesMu.Lock()
+	defer n.nftablesMu.Unlock()
+	if n.nftables == nil {
+		n.nftables = newRuleset()
+	}
+	return n.nftables
+}
+
+// PingGroupRange returns the inclusive range of groups whose members may create
+// ICMP echo sockets in n.
+func (n *Namespace) PingGroupRange() (min, max auth.KGID) {
+	n.pingGroupRangeMu.Lock()
+	defer n.pingGroupRangeMu.Unlock()
+	return n.pingGroupRange[0], n.pingGroupRange[1]
+}
+
+// SetPingGroupRange sets the inclusive range of groups whose members may
+// create ICMP echo sockets in n. If min > max, no group may create them.
+func (n *Namespace) SetPingGroupRange(min, max auth.KGID) {
+	n.pingGroupRangeMu.Lock()
+	defer n.pingGroupRangeMu.Unlock()
+	n.pingGroupRange = [2]auth.KGID{min, max}
+}
+
+// MayCreatePingSocket returns true if creds permit the creation of ICMP echo
+// sockets in n. Compare Linux's net/ipv4/ping.c:ping_init_sock().
+func (n *Namespace) MayCreatePingSocket(creds *auth.Credentials) bool {
+	min, max := n.PingGroupRange()
+	inRange := func(kgid auth.KGID) bool {
+		return min <= kgid && kgid <= max
+	}
+	if inRange(creds.EffectiveKGID) {
+		return true
+	}
+	for _, kgid := range creds.ExtraKGIDs {
+		if inRange(kgid) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsRoot returns whether n is the root network namespace.
 func (n *Namespace) IsRoot() bool {
 	return n.isRoot
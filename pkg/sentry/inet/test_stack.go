@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
@@ -32,6 +33,7 @@ type TestStack struct {
 	TCPSendBufSize    TCPBufferSize
 	TCPSACKFlag       bool
 	Recovery          TCPLossRecovery
+	Retries2          uint32
 	IPForwarding      bool
 }
 
@@ -60,6 +62,21 @@ func (s *TestStack) RemoveInterface(idx int32) error {
 	return nil
 }
 
+// SetInterfaceUp implements Stack.
+func (s *TestStack) SetInterfaceUp(idx int32, up bool) error {
+	iface, ok := s.InterfacesMap[idx]
+	if !ok {
+		return fmt.Errorf("unknown idx: %d", idx)
+	}
+	if up {
+		iface.Flags |= linux.IFF_UP
+	} else {
+		iface.Flags &^= linux.IFF_UP
+	}
+	s.InterfacesMap[idx] = iface
+	return nil
+}
+
 // InterfaceAddrs implements Stack.
 func (s *TestStack) InterfaceAddrs() map[int32][]InterfaceAddr {
 	return s.InterfaceAddrsMap
@@ -138,6 +155,17 @@ func (s *TestStack) SetTCPRecovery(recovery TCPLossRecovery) error {
 	return nil
 }
 
+// TCPRetries2 implements Stack.
+func (s *TestStack) TCPRetries2() (uint32, error) {
+	return s.Retries2, nil
+}
+
+// SetTCPRetries2 implements Stack.
+func (s *TestStack) SetTCPRetries2(retries uint32) error {
+	s.Retries2 = retries
+	return nil
+}
+
 // Statistics implements Stack.
 func (s *TestStack) Statistics(stat interface{}, arg string) error {
 	return nil
@@ -148,6 +176,23 @@ func (s *TestStack) RouteTable() []Route {
 	return s.RouteList
 }
 
+// AddRoute implements Stack.
+func (s *TestStack) AddRoute(route Route, flags uint16) error {
+	s.RouteList = append(s.RouteList, route)
+	return nil
+}
+
+// RemoveRoute implements Stack.
+func (s *TestStack) RemoveRoute(route Route) error {
+	for i, rt := range s.RouteList {
+		if rt.Family == route.Family && rt.DstLen == route.DstLen && bytes.Equal(rt.DstAddr, route.DstAddr) {
+			s.RouteList = append(s.RouteList[:i], s.RouteList[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown route: %+v", route)
+}
+
 // Pause implements Stack.
 func (s *TestStack) Pause() {}
 
@@ -184,3 +229,30 @@ func (*TestStack) SetPortRange(start uint16, end uint16) error {
 	// No-op.
 	return nil
 }
+
+// ConnTrackTimeouts implements Stack.
+func (*TestStack) ConnTrackTimeouts() (stack.ConnTrackTimeouts, error) {
+	return stack.DefaultConnTrackTimeouts(), nil
+}
+
+// SetConnTrackTimeouts implements Stack.
+func (*TestStack) SetConnTrackTimeouts(stack.ConnTrackTimeouts) error {
+	// No-op.
+	return nil
+}
+
+// ConnTrackMax implements Stack.
+func (*TestStack) ConnTrackMax() (int, error) {
+	return stack.DefaultConnTrackMax, nil
+}
+
+// SetConnTrackMax implements Stack.
+func (*TestStack) SetConnTrackMax(int) error {
+	// No-op.
+	return nil
+}
+
+// ConnTrackCount implements Stack.
+func (*TestStack) ConnTrackCount() (int, error) {
+	return 0, nil
+}
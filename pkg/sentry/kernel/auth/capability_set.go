@@ -15,8 +15,11 @@
 package auth
 
 import (
+	"encoding/binary"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/bits"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 )
 
 // A CapabilitySet is a set of capabilities implemented as a bitset. The zero
@@ -59,3 +62,88 @@ type TaskCapabilities struct {
 	// execve(2) of a program that is not privileged.
 	AmbientCaps CapabilitySet
 }
+
+// VfsCapData is equivalent to Linux's cpu_vfs_cap_data. It holds the
+// capabilities of an executable file, which are stored in its
+// security.capability extended attribute.
+//
+// +stateify savable
+type VfsCapData struct {
+	// MagicEtc contains the revision and flags of the file capabilities.
+	MagicEtc uint32
+
+	// RootID is the root UID of the user namespace in which the file
+	// capabilities were set.
+	RootID KUID
+
+	// Permitted is the file permitted capability set.
+	Permitted CapabilitySet
+
+	// Inheritable is the file inheritable capability set.
+	Inheritable CapabilitySet
+}
+
+// Effective returns true if the file effective bit is set, i.e. if the new
+// permitted capabilities of a task executing the file are also effective.
+func (c *VfsCapData) Effective() bool {
+	return c.MagicEtc&linux.VFS_CAP_FLAGS_EFFECTIVE != 0
+}
+
+// VfsCapDataOf parses data, the value of a security.capability extended
+// attribute. This is analogous to Linux's
+// security/commoncap.c:get_vfs_caps_from_disk().
+//
+// Since filesystems in the sentry don't convert file capabilities between
+// user namespaces, version 2 file capabilities belong to the root user
+// namespace.
+func VfsCapDataOf(data string) (VfsCapData, error) {
+	b := []byte(data)
+	if len(b) < 4 {
+		return VfsCapData{}, linuxerr.EINVAL
+	}
+	magicEtc := binary.LittleEndian.Uint32(b)
+	var caps VfsCapData
+	caps.MagicEtc = magicEtc
+	caps.RootID = RootKUID
+	switch magicEtc & linux.VFS_CAP_REVISION_MASK {
+	case linux.VFS_CAP_REVISION_1:
+		if len(b) != linux.XATTR_CAPS_SZ_1 {
+			return VfsCapData{}, linuxerr.EINVAL
+		}
+		caps.Permitted = CapabilitySet(binary.LittleEndian.Uint32(b[4:]))
+		caps.Inheritable = CapabilitySet(binary.LittleEndian.Uint32(b[8:]))
+	case linux.VFS_CAP_REVISION_2, linux.VFS_CAP_REVISION_3:
+		size := linux.XATTR_CAPS_SZ_2
+		if magicEtc&linux.VFS_CAP_REVISION_MASK == linux.VFS_CAP_REVISION_3 {
+			size = linux.XATTR_CAPS_SZ_3
+		}
+		if len(b) != size {
+			return VfsCapData{}, linuxerr.EINVAL
+		}
+		// The xattr contains pairs of 32-bit permitted and inheritable
+		// sets, least significant first.
+		caps.Permitted = CapabilitySet(uint64(binary.LittleEndian.Uint32(b[4:])) | uint64(binary.LittleEndian.Uint32(b[12:]))<<32)
+		caps.Inheritable = CapabilitySet(uint64(binary.LittleEndian.Uint32(b[8:])) | uint64(binary.LittleEndian.Uint32(b[16:]))<<32)
+		if size == linux.XATTR_CAPS_SZ_3 {
+			caps.RootID = KUID(binary.LittleEndian.Uint32(b[20:]))
+		}
+	default:
+		return VfsCapData{}, linuxerr.EINVAL
+	}
+	// Ignore capabilities that we don't know about, as Linux does.
+	caps.Permitted &= AllCapabilities
+	caps.Inheritable &= AllCapabilities
+	return caps, nil
+}
+
+// OwnedBy returns true if the file capabilities apply to tasks in ns, i.e. if
+// they were set by the root user of ns or of one of its ancestors. This is
+// analogous to Linux's security/commoncap.c:rootid_owns_currentns().
+func (c *VfsCapData) OwnedBy(ns *UserNamespace) bool {
+	for ; ns != nil; ns = ns.parent {
+		if ns.MapFromKUID(c.RootID) == RootUID {
+			return true
+		}
+	}
+	return false
+}
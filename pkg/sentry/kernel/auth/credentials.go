@@ -56,6 +56,16 @@ type Credentials struct {
 	// maintained after a switch from root user to non-root user via setuid().
 	KeepCaps bool
 
+	// LandlockDomain is the set of Landlock rulesets enforced by
+	// landlock_restrict_self(2). If LandlockDomain is nil, the credentials
+	// are not restricted by Landlock.
+	LandlockDomain *LandlockDomain
+
+	// SessionKeyring is the session keyring set by
+	// keyctl(KEYCTL_JOIN_SESSION_KEYRING). If SessionKeyring is nil, the user
+	// session keyring is used instead. See session-keyring(7).
+	SessionKeyring *Key
+
 	// The user namespace associated with the owner of the credentials.
 	UserNamespace *UserNamespace
 }
@@ -0,0 +1,843 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+// KeySerial is the serial number of a key. The serial numbers of keys are
+// positive; see linux.KEY_SPEC_* for special values that refer to keyrings of
+// the calling task.
+type KeySerial int32
+
+// KeyPermissions is a key permission mask; see linux.KEY_POS_* etc.
+type KeyPermissions uint32
+
+// Permissions required by key operations, within each of the possessor,
+// user, group and other masks of KeyPermissions.
+const (
+	KeyView    KeyPermissions = linux.KEY_OTH_VIEW
+	KeyRead    KeyPermissions = linux.KEY_OTH_READ
+	KeyWrite   KeyPermissions = linux.KEY_OTH_WRITE
+	KeySearch  KeyPermissions = linux.KEY_OTH_SEARCH
+	KeyLink    KeyPermissions = linux.KEY_OTH_LINK
+	KeySetAttr KeyPermissions = linux.KEY_OTH_SETATTR
+
+	keyPermissionsAll = linux.KEY_POS_ALL | linux.KEY_USR_ALL | linux.KEY_GRP_ALL | linux.KEY_OTH_ALL
+)
+
+// KeyType is the type of a key.
+type KeyType int
+
+const (
+	// KeyTypeUser is the "user" key type, whose payload is an arbitrary blob
+	// of data. See user-keyring(7).
+	KeyTypeUser KeyType = iota
+
+	// KeyTypeKeyring is the "keyring" key type, whose payload is a set of
+	// links to other keys. See keyrings(7).
+	KeyTypeKeyring
+)
+
+// String implements fmt.Stringer.String.
+func (t KeyType) String() string {
+	switch t {
+	case KeyTypeUser:
+		return "user"
+	case KeyTypeKeyring:
+		return "keyring"
+	default:
+		return fmt.Sprintf("KeyType(%d)", int(t))
+	}
+}
+
+// ParseKeyType returns the KeyType with the given name.
+func ParseKeyType(name string) (KeyType, bool) {
+	switch name {
+	case "user":
+		return KeyTypeUser, true
+	case "keyring":
+		return KeyTypeKeyring, true
+	default:
+		return 0, false
+	}
+}
+
+// Default key permissions. Compare Linux's security/keys/key.c:
+// key_create_or_update() and security/keys/process_keys.c.
+const (
+	// keyPermDefault is the permission mask of keys added by add_key(2).
+	keyPermDefault = linux.KEY_POS_ALL | linux.KEY_USR_VIEW
+
+	// keyPermSession is the permission mask of session keyrings.
+	keyPermSession = linux.KEY_POS_ALL | linux.KEY_USR_VIEW | linux.KEY_USR_READ | linux.KEY_USR_LINK
+
+	// keyPermUser is the permission mask of per-user keyrings.
+	keyPermUser = linux.KEY_POS_ALL | linux.KEY_USR_ALL
+)
+
+// A Key is a key or a keyring. See keyrings(7).
+//
+// +stateify savable
+type Key struct {
+	// serial, keyType and description are immutable.
+	serial      KeySerial
+	keyType     KeyType
+	description string
+
+	// The following fields are protected by the mu of the KeySet containing
+	// the key.
+
+	// uid and gid are the owners of the key.
+	uid KUID
+	gid KGID
+
+	// perm is the key's permission mask.
+	perm KeyPermissions
+
+	// payload is the payload of a user key.
+	payload []byte
+
+	// links are the keys linked to by a keyring, in the order in which they
+	// were linked.
+	links []*Key
+
+	// revoked is true if the key was revoked by keyctl(KEYCTL_REVOKE).
+	revoked bool
+
+	// quotaLen is the number of bytes of the owner's quota used by the
+	// key.
+	quotaLen uint64
+}
+
+// Serial returns the key's serial number.
+func (k *Key) Serial() KeySerial {
+	return k.serial
+}
+
+// Type returns the key's type.
+func (k *Key) Type() KeyType {
+	return k.keyType
+}
+
+// Description returns the key's description.
+func (k *Key) Description() string {
+	return k.description
+}
+
+// permittedLocked returns true if creds have all permissions in need for k.
+// possessed is true if k is possessed by the task with creds. Compare Linux's
+// security/keys/permission.c:key_task_permission().
+//
+// Preconditions: The KeySet containing k is locked.
+func (k *Key) permittedLocked(creds *Credentials, possessed bool, need KeyPermissions) bool {
+	var granted KeyPermissions
+	switch {
+	case k.uid == creds.EffectiveKUID:
+		granted = k.perm >> 16
+	case creds.InGroup(k.gid):
+		granted = k.perm >> 8
+	default:
+		granted = k.perm
+	}
+	if possessed {
+		granted |= k.perm >> 24
+	}
+	return granted&need == need
+}
+
+// linkedLocked returns the key linked to by keyring k with the given type and
+// description, or nil if there is none.
+//
+// Preconditions: The KeySet containing k is locked.
+func (k *Key) linkedLocked(keyType KeyType, description string) *Key {
+	for _, l := range k.links {
+		if l.keyType == keyType && l.description == description {
+			return l
+		}
+	}
+	return nil
+}
+
+// KeyRequester is a task performing key operations. A task possesses the
+// thread, process and session keyrings that it is subscribed to, as well as
+// the keys that can be found by searching them. See keyrings(7).
+type KeyRequester struct {
+	// Creds are the task's credentials.
+	Creds *Credentials
+
+	// Thread, Process and Session are the task's thread, process and session
+	// keyrings, or nil if the task isn't subscribed to such a keyring.
+	Thread  *Key
+	Process *Key
+	Session *Key
+}
+
+// KeyLimits are the limits on the number of keys and bytes of key data owned
+// by each user, as in /proc/sys/kernel/keys.
+//
+// +stateify savable
+type KeyLimits struct {
+	MaxKeys      uint32
+	MaxBytes     uint32
+	RootMaxKeys  uint32
+	RootMaxBytes uint32
+}
+
+// keyQuota is the usage of a user's key quota.
+//
+// +stateify savable
+type keyQuota struct {
+	keys  uint64
+	bytes uint64
+}
+
+// KeySet contains the keys of a user namespace tree.
+//
+// +stateify savable
+type KeySet struct {
+	mu keySetMutex `state:"nosave"`
+
+	// keys maps serial numbers to keys. Keys are removed from keys by
+	// Collect once they are unreachable. keys is protected by mu.
+	keys map[KeySerial]*Key
+
+	// lastSerial is the last serial number allocated. lastSerial is
+	// protected by mu.
+	lastSerial KeySerial
+
+	// userKeyrings and userSessionKeyrings map users to their user and user
+	// session keyrings, which are created on demand and never collected.
+	// Both are protected by mu.
+	userKeyrings        map[KUID]*Key
+	userSessionKeyrings map[KUID]*Key
+
+	// quotas maps users to the usage of their key quota. quotas is protected
+	// by mu.
+	quotas map[KUID]*keyQuota
+
+	// limits is protected by mu.
+	limits KeyLimits
+}
+
+// NewKeySet returns a KeySet without any keys.
+func NewKeySet() *KeySet {
+	return &KeySet{
+		keys:                make(map[KeySerial]*Key),
+		userKeyrings:        make(map[KUID]*Key),
+		userSessionKeyrings: make(map[KUID]*Key),
+		quotas:              make(map[KUID]*keyQuota),
+		limits: KeyLimits{
+			MaxKeys:      linux.KEY_QUOTA_MAXKEYS,
+			MaxBytes:     linux.KEY_QUOTA_MAXBYTES,
+			RootMaxKeys:  linux.KEY_QUOTA_ROOT_MAXKEYS,
+			RootMaxBytes: linux.KEY_QUOTA_ROOT_MAXBYTES,
+		},
+	}
+}
+
+// Limits returns the key quota limits.
+func (s *KeySet) Limits() KeyLimits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limits
+}
+
+// SetLimits sets the key quota limits. Keys that already exceed the new
+// limits are not removed.
+func (s *KeySet) SetLimits(limits KeyLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = limits
+}
+
+// quotaLen returns the number of bytes of quota used by a key with the given
+// description and payload. Compare Linux's security/keys/key.c:key_alloc().
+func quotaLen(description string, payload []byte) uint64 {
+	return uint64(len(description) + 1 + len(payload))
+}
+
+// chargeLocked charges n bytes and, if newKey is true, a key to the quota of
+// uid. If overrun is true, the quota may be exceeded.
+//
+// Preconditions: s.mu is locked.
+func (s *KeySet) chargeLocked(uid KUID, n uint64, newKey, overrun bool) error {
+	q := s.quotas[uid]
+	if q == nil {
+		q = &keyQuota{}
+		s.quotas[uid] = q
+	}
+	maxKeys, maxBytes := s.limits.MaxKeys, s.limits.MaxBytes
+	if uid == RootKUID {
+		maxKeys, maxBytes = s.limits.RootMaxKeys, s.limits.RootMaxBytes
+	}
+	keys := q.keys
+	if newKey {
+		keys++
+	}
+	if !overrun && (keys > uint64(maxKeys) || q.bytes+n > uint64(maxBytes)) {
+		return linuxerr.EDQUOT
+	}
+	q.keys = keys
+	q.bytes += n
+	return nil
+}
+
+// unchargeLocked reverses chargeLocked.
+//
+// Preconditions: s.mu is locked.
+func (s *KeySet) unchargeLocked(uid KUID, n uint64, key bool) {
+	q := s.quotas[uid]
+	q.bytes -= n
+	if key {
+		q.keys--
+	}
+	if q.keys == 0 && q.bytes == 0 {
+		delete(s.quotas, uid)
+	}
+}
+
+// newKeyLocked creates a key owned by creds.
+//
+// Preconditions: s.mu is locked.
+func (s *KeySet) newKeyLocked(creds *Credentials, keyType KeyType, description string, payload []byte, perm KeyPermissions, overrun bool) (*Key, error) {
+	n := quotaLen(description, payload)
+	if err := s.chargeLocked(creds.EffectiveKUID, n, true /* newKey */, overrun); err != nil {
+		return nil, err
+	}
+	for {
+		s.lastSerial++
+		if s.lastSerial <= 0 {
+			s.lastSerial = 1
+		}
+		if _, ok := s.keys[s.lastSerial]; !ok {
+			break
+		}
+	}
+	k := &Key{
+		serial:      s.lastSerial,
+		keyType:     keyType,
+		description: description,
+		uid:         creds.EffectiveKUID,
+		gid:         creds.EffectiveKGID,
+		perm:        perm,
+		payload:     append([]byte(nil), payload...),
+		quotaLen:    n,
+	}
+	s.keys[k.serial] = k
+	return k, nil
+}
+
+// possessedLocked returns true if r possesses k. Compare Linux's
+// security/keys/process_keys.c:search_cred_keyrings_rcu().
+//
+// Preconditions: s.mu is locked.
+func (s *KeySet) possessedLocked(r *KeyRequester, k *Key) bool {
+	var queue []*Key
+	for _, kr := range []*Key{r.Thread, r.Process, r.Session} {
+		if kr != nil {
+			queue = append(queue, kr)
+		}
+	}
+	// Tasks without a session keyring use their user session keyring.
+	if r.Session == nil {
+		if kr := s.userSessionKeyrings[r.Creds.EffectiveKUID]; kr != nil {
+			queue = append(queue, kr)
+		}
+	}
+	seen := make(map[*Key]struct{})
+	for len(queue) != 0 {
+		kr := queue[0]
+		queue = queue[1:]
+		if kr == k {
+			return true
+		}
+		if _, ok := seen[kr]; ok {
+			continue
+		}
+		seen[kr] = struct{}{}
+		// Keys linked to by a possessed keyring are only possessed if the
+		// keyring can be searched.
+		if kr.keyType != KeyTypeKeyring || kr.revoked || !kr.permittedLocked(r.Creds, true /* possessed */, KeySearch) {
+			continue
+		}
+		queue = append(queue, kr.links...)
+	}
+	return false
+}
+
+// checkLocked returns an error if k is revoked, or if r doesn't have the
+// permissions in need for k.
+//
+// Preconditions: s.mu is locked.
+func (s *KeySet) checkLocked(r *KeyRequester, k *Key, need KeyPermissions) error {
+	if k.revoked {
+		return linuxerr.EKEYREVOKED
+	}
+	if !k.permittedLocked(r.Creds, s.possessedLocked(r, k), need) {
+		return linuxerr.EACCES
+	}
+	return nil
+}
+
+// checkKeyringLocked is like checkLocked, but also requires k to be a
+// keyring.
+//
+// Preconditions: s.mu is locked.
+func (s *KeySet) checkKeyringLocked(r *KeyRequester, k *Key, need KeyPermissions) error {
+	if err := s.checkLocked(r, k, need); err != nil {
+		return err
+	}
+	if k.keyType != KeyTypeKeyring {
+		return linuxerr.ENOTDIR
+	}
+	return nil
+}
+
+// linkLocked links keyring to k, displacing any link to another key with the
+// same type and description. Compare Linux's
+// security/keys/keyring.c:__key_link().
+//
+// Preconditions: s.mu is locked. keyring is a keyring.
+func (s *KeySet) linkLocked(keyring, k *Key) error {
+	// A keyring may not link to itself, directly or indirectly.
+	if k.keyType == KeyTypeKeyring && s.reachableLocked(k, keyring) {
+		return linuxerr.EDEADLK
+	}
+	for i, l := range keyring.links {
+		if l == k {
+			return nil
+		}
+		if l.keyType == k.keyType && l.description == k.description {
+			keyring.links[i] = k
+			return nil
+		}
+	}
+	keyring.links = append(keyring.links, k)
+	return nil
+}
+
+// reachableLocked returns true if keyring to is reachable from keyring from.
+//
+// Preconditions: s.mu is locked.
+func (s *KeySet) reachableLocked(from, to *Key) bool {
+	if from == to {
+		return true
+	}
+	for _, l := range from.links {
+		if l.keyType == KeyTypeKeyring && s.reachableLocked(l, to) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the key with the given serial number.
+func (s *KeySet) Get(serial KeySerial) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[serial]
+	if !ok {
+		return nil, linuxerr.ENOKEY
+	}
+	return k, nil
+}
+
+// NewKeyring creates a new keyring owned by creds, for use as a thread or
+// process keyring. Such keyrings may exceed the creator's quota.
+func (s *KeySet) NewKeyring(creds *Credentials, description string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.newKeyLocked(creds, KeyTypeKeyring, description, nil, keyPermDefault, true /* overrun */)
+}
+
+// UserKeyring returns the user keyring, or the user session keyring if
+// session is true, of the user with creds, creating it if necessary. See
+// user-keyring(7) and user-session-keyring(7).
+func (s *KeySet) UserKeyring(creds *Credentials, session bool) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userKeyringLocked(creds, session)
+}
+
+// userKeyringLocked implements UserKeyring.
+//
+// Preconditions: s.mu is locked.
+func (s *KeySet) userKeyringLocked(creds *Credentials, session bool) (*Key, error) {
+	uid := creds.EffectiveKUID
+	if session {
+		if kr := s.userSessionKeyrings[uid]; kr != nil {
+			return kr, nil
+		}
+	} else if kr := s.userKeyrings[uid]; kr != nil {
+		return kr, nil
+	}
+
+	// "The user-session keyring ... is linked to the user keyring." -
+	// user-session-keyring(7)
+	id := uid.In(creds.UserNamespace).OrOverflow()
+	ukr := s.userKeyrings[uid]
+	if ukr == nil {
+		var err error
+		ukr, err = s.newKeyLocked(creds, KeyTypeKeyring, fmt.Sprintf("_uid.%d", id), nil, keyPermUser, true /* overrun */)
+		if err != nil {
+			return nil, err
+		}
+		s.userKeyrings[uid] = ukr
+	}
+	if !session {
+		return ukr, nil
+	}
+	skr, err := s.newKeyLocked(creds, KeyTypeKeyring, fmt.Sprintf("_uid_ses.%d", id), nil, keyPermUser, true /* overrun */)
+	if err != nil {
+		return nil, err
+	}
+	skr.links = append(skr.links, ukr)
+	s.userSessionKeyrings[uid] = skr
+	return skr, nil
+}
+
+// JoinSession returns the session keyring that r should join, as for
+// keyctl(KEYCTL_JOIN_SESSION_KEYRING). If name is empty, a new anonymous
+// keyring is created. Otherwise, the existing keyring with the given name is
+// returned if r may search it, and a new keyring with that name is created
+// if there is no such keyring.
+func (s *KeySet) JoinSession(r *KeyRequester, name string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		return s.newKeyLocked(r.Creds, KeyTypeKeyring, "_ses", nil, keyPermSession, false /* overrun */)
+	}
+	// Compare Linux's security/keys/keyring.c:find_keyring_by_name(), which
+	// doesn't consider per-user keyrings.
+	for _, k := range s.keys {
+		if k.keyType != KeyTypeKeyring || k.description != name || k.revoked {
+			continue
+		}
+		if s.userKeyrings[k.uid] == k || s.userSessionKeyrings[k.uid] == k {
+			continue
+		}
+		if !k.permittedLocked(r.Creds, false /* possessed */, KeySearch) {
+			continue
+		}
+		return k, nil
+	}
+	return s.newKeyLocked(r.Creds, KeyTypeKeyring, name, nil, keyPermSession, false /* overrun */)
+}
+
+// Add implements the semantics of add_key(2): it adds a key with the given
+// type, description and payload to keyring, and returns it. If keyring
+// already links to a user key with the same description, that key is updated
+// instead.
+func (s *KeySet) Add(r *KeyRequester, keyType KeyType, description string, payload []byte, keyring *Key) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkKeyringLocked(r, keyring, KeyWrite); err != nil {
+		return nil, err
+	}
+	if keyType == KeyTypeUser {
+		if k := keyring.linkedLocked(keyType, description); k != nil && !k.revoked {
+			if err := s.checkLocked(r, k, KeyWrite); err != nil {
+				return nil, err
+			}
+			return k, s.updateLocked(k, payload)
+		}
+	}
+	k, err := s.newKeyLocked(r.Creds, keyType, description, payload, keyPermDefault, false /* overrun */)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.linkLocked(keyring, k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Update implements keyctl(KEYCTL_UPDATE).
+func (s *KeySet) Update(r *KeyRequester, k *Key, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkLocked(r, k, KeyWrite); err != nil {
+		return err
+	}
+	if k.keyType != KeyTypeUser {
+		return linuxerr.EOPNOTSUPP
+	}
+	return s.updateLocked(k, payload)
+}
+
+// updateLocked replaces the payload of user key k.
+//
+// Preconditions: s.mu is locked.
+func (s *KeySet) updateLocked(k *Key, payload []byte) error {
+	n := quotaLen(k.description, payload)
+	if n > k.quotaLen {
+		if err := s.chargeLocked(k.uid, n-k.quotaLen, false /* newKey */, false /* overrun */); err != nil {
+			return err
+		}
+	} else {
+		s.unchargeLocked(k.uid, k.quotaLen-n, false /* key */)
+	}
+	k.quotaLen = n
+	k.payload = append([]byte(nil), payload...)
+	return nil
+}
+
+// Revoke implements keyctl(KEYCTL_REVOKE).
+func (s *KeySet) Revoke(r *KeyRequester, k *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Either Write or SetAttr permission is sufficient.
+	if err := s.checkLocked(r, k, KeyWrite); err != nil {
+		if err := s.checkLocked(r, k, KeySetAttr); err != nil {
+			return err
+		}
+	}
+	k.revoked = true
+	return nil
+}
+
+// SetPerm implements keyctl(KEYCTL_SETPERM).
+func (s *KeySet) SetPerm(r *KeyRequester, k *Key, perm KeyPermissions) error {
+	if perm&^keyPermissionsAll != 0 {
+		return linuxerr.EINVAL
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkLocked(r, k, KeySetAttr); err != nil {
+		return err
+	}
+	// "The caller must either have the CAP_SYS_ADMIN capability, or have the
+	// same filesystem UID as the key." - keyctl(2)
+	if k.uid != r.Creds.EffectiveKUID && !r.Creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, r.Creds.UserNamespace.Root()) {
+		return linuxerr.EACCES
+	}
+	k.perm = perm
+	return nil
+}
+
+// Describe implements keyctl(KEYCTL_DESCRIBE): it returns a description of k
+// in the form "type;uid;gid;perm;description".
+func (s *KeySet) Describe(r *KeyRequester, k *Key) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkLocked(r, k, KeyView); err != nil {
+		return "", err
+	}
+	ns := r.Creds.UserNamespace
+	return fmt.Sprintf("%s;%d;%d;%08x;%s", k.keyType, k.uid.In(ns).OrOverflow(), k.gid.In(ns).OrOverflow(), uint32(k.perm), k.description), nil
+}
+
+// Read implements keyctl(KEYCTL_READ): it returns the payload of a user key,
+// or the serial numbers of the keys linked to by a keyring.
+func (s *KeySet) Read(r *KeyRequester, k *Key) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k.revoked {
+		return nil, linuxerr.EKEYREVOKED
+	}
+	// "... the key must either grant the caller read permission, or grant
+	// the caller search permission when searched for from the process
+	// keyrings (i.e., the key is possessed)." - keyctl(2)
+	possessed := s.possessedLocked(r, k)
+	if !k.permittedLocked(r.Creds, possessed, KeyRead) && !(possessed && k.permittedLocked(r.Creds, possessed, KeySearch)) {
+		return nil, linuxerr.EACCES
+	}
+	if k.keyType == KeyTypeUser {
+		return append([]byte(nil), k.payload...), nil
+	}
+	buf := make([]byte, 4*len(k.links))
+	for i, l := range k.links {
+		hostarch.ByteOrder.PutUint32(buf[4*i:], uint32(l.serial))
+	}
+	return buf, nil
+}
+
+// Link implements keyctl(KEYCTL_LINK).
+func (s *KeySet) Link(r *KeyRequester, k, keyring *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkLocked(r, k, KeyLink); err != nil {
+		return err
+	}
+	if err := s.checkKeyringLocked(r, keyring, KeyWrite); err != nil {
+		return err
+	}
+	return s.linkLocked(keyring, k)
+}
+
+// Unlink implements keyctl(KEYCTL_UNLINK). k may be revoked.
+func (s *KeySet) Unlink(r *KeyRequester, k, keyring *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkKeyringLocked(r, keyring, KeyWrite); err != nil {
+		return err
+	}
+	for i, l := range keyring.links {
+		if l == k {
+			keyring.links = append(keyring.links[:i], keyring.links[i+1:]...)
+			return nil
+		}
+	}
+	return linuxerr.ENOENT
+}
+
+// Clear implements keyctl(KEYCTL_CLEAR).
+func (s *KeySet) Clear(r *KeyRequester, keyring *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkKeyringLocked(r, keyring, KeyWrite); err != nil {
+		return err
+	}
+	keyring.links = nil
+	return nil
+}
+
+// Search implements keyctl(KEYCTL_SEARCH): it searches keyring, and the
+// keyrings linked to by it that r may search, for a key with the given type
+// and description that r may search for.
+func (s *KeySet) Search(r *KeyRequester, keyring *Key, keyType KeyType, description string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkKeyringLocked(r, keyring, KeySearch); err != nil {
+		return nil, err
+	}
+	// Keys found by searching a possessed keyring are possessed too.
+	possessed := s.possessedLocked(r, keyring)
+	err := linuxerr.ENOKEY
+	queue := []*Key{keyring}
+	seen := make(map[*Key]struct{})
+	for len(queue) != 0 {
+		kr := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[kr]; ok {
+			continue
+		}
+		seen[kr] = struct{}{}
+		for _, k := range kr.links {
+			if k.keyType == keyType && k.description == description {
+				if !k.permittedLocked(r.Creds, possessed, KeySearch) {
+					continue
+				}
+				if k.revoked {
+					err = linuxerr.EKEYREVOKED
+					continue
+				}
+				return k, nil
+			}
+			if k.keyType == KeyTypeKeyring && !k.revoked && k.permittedLocked(r.Creds, possessed, KeySearch) {
+				queue = append(queue, k)
+			}
+		}
+	}
+	return nil, err
+}
+
+// KeyInfo describes a key for /proc/keys.
+type KeyInfo struct {
+	Serial      KeySerial
+	Type        KeyType
+	Description string
+	UID         UID
+	GID         GID
+	Perm        KeyPermissions
+	Revoked     bool
+
+	// Usage is the number of keyrings linking to the key.
+	Usage int
+
+	// Length is the length of the payload of a user key, or the number of
+	// links of a keyring.
+	Length int
+}
+
+// ForEachVisible calls fn for each key that r may view, in order of serial
+// number.
+func (s *KeySet) ForEachVisible(r *KeyRequester, fn func(KeyInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := make(map[*Key]int)
+	serials := make([]KeySerial, 0, len(s.keys))
+	for serial, k := range s.keys {
+		serials = append(serials, serial)
+		for _, l := range k.links {
+			usage[l]++
+		}
+	}
+	sort.Slice(serials, func(i, j int) bool { return serials[i] < serials[j] })
+	ns := r.Creds.UserNamespace
+	for _, serial := range serials {
+		k := s.keys[serial]
+		if !k.permittedLocked(r.Creds, s.possessedLocked(r, k), KeyView) {
+			continue
+		}
+		info := KeyInfo{
+			Serial:      k.serial,
+			Type:        k.keyType,
+			Description: k.description,
+			UID:         k.uid.In(ns).OrOverflow(),
+			GID:         k.gid.In(ns).OrOverflow(),
+			Perm:        k.perm,
+			Revoked:     k.revoked,
+			Usage:       usage[k],
+			Length:      len(k.payload),
+		}
+		if k.keyType == KeyTypeKeyring {
+			info.Length = len(k.links)
+		}
+		fn(info)
+	}
+}
+
+// Collect removes keys that are unreachable from roots, which are the keyrings
+// that tasks are subscribed to, and from per-user keyrings. Removed keys are
+// no longer charged to their owners' quotas.
+func (s *KeySet) Collect(roots []*Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reachable := make(map[*Key]struct{})
+	var mark func(k *Key)
+	mark = func(k *Key) {
+		if _, ok := reachable[k]; ok {
+			return
+		}
+		reachable[k] = struct{}{}
+		for _, l := range k.links {
+			mark(l)
+		}
+	}
+	for _, k := range roots {
+		mark(k)
+	}
+	for _, k := range s.userKeyrings {
+		mark(k)
+	}
+	for _, k := range s.userSessionKeyrings {
+		mark(k)
+	}
+	for serial, k := range s.keys {
+		if _, ok := reachable[k]; ok {
+			continue
+		}
+		delete(s.keys, serial)
+		s.unchargeLocked(k.uid, k.quotaLen, true /* key */)
+	}
+}
@@ -33,6 +33,10 @@ type UserNamespace struct {
 	// namespace. owner is immutable.
 	owner KUID
 
+	// keys contains the keys of the user namespace tree. keys is only set in
+	// the root namespace, and is immutable.
+	keys *KeySet
+
 	// mu protects the following fields.
 	//
 	// If mu will be locked in multiple UserNamespaces, it must be locked in
@@ -57,7 +61,9 @@ type UserNamespace struct {
 // by this function, the returned value must be reused to refer to the same
 // namespace.
 func NewRootUserNamespace() *UserNamespace {
-	var ns UserNamespace
+	ns := UserNamespace{
+		keys: NewKeySet(),
+	}
 	// """
 	// The initial user namespace has no parent namespace, but, for
 	// consistency, the kernel provides dummy user and group ID mapping files
@@ -80,6 +86,11 @@ func NewRootUserNamespace() *UserNamespace {
 	return &ns
 }
 
+// Keys returns the keys of the user namespace tree containing ns.
+func (ns *UserNamespace) Keys() *KeySet {
+	return ns.Root().keys
+}
+
 // Root returns the root of the user namespace tree containing ns.
 func (ns *UserNamespace) Root() *UserNamespace {
 	for ns.parent != nil {
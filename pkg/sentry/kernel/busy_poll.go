@@ -0,0 +1,93 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"runtime"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/metric"
+)
+
+var (
+	busyPollHits   = metric.MustCreateNewUint64Metric("/netstack/busy_poll/hits", false /* sync */, "Number of busy polls that found a waited-for event, avoiding a sleep.")
+	busyPollSleeps = metric.MustCreateNewUint64Metric("/netstack/busy_poll/sleeps", false /* sync */, "Number of busy polls that ended without an event, after which the task slept.")
+)
+
+// maxBusyPoll bounds the time that a task busy polls before sleeping, so that
+// a busy polling task gives up its timeslice like in Linux, where busy polling
+// stops when the task needs to be rescheduled.
+const maxBusyPoll = linux.ClockTick
+
+// NetBusyRead returns the value of /proc/sys/net/core/busy_read: the default
+// SO_BUSY_POLL for new sockets in microseconds.
+func (k *Kernel) NetBusyRead() uint32 {
+	return k.busyRead.Load()
+}
+
+// SetNetBusyRead sets the value returned by NetBusyRead.
+func (k *Kernel) SetNetBusyRead(usec uint32) {
+	k.busyRead.Store(usec)
+}
+
+// NetBusyPoll returns the value of /proc/sys/net/core/busy_poll: the time that
+// poll(2), select(2) and epoll_wait(2) busy poll before sleeping in
+// microseconds.
+func (k *Kernel) NetBusyPoll() uint32 {
+	return k.busyPoll.Load()
+}
+
+// SetNetBusyPoll sets the value returned by NetBusyPoll.
+func (k *Kernel) SetNetBusyPoll(usec uint32) {
+	k.busyPoll.Store(usec)
+}
+
+// BusyPoller is implemented by file descriptions whose blocking reads busy
+// poll before sleeping, such as sockets with SO_BUSY_POLL set.
+type BusyPoller interface {
+	// BusyPollUsec returns the time that blocking reads busy poll before
+	// sleeping, in microseconds.
+	BusyPollUsec() uint32
+}
+
+// BusyPoll spins until ready returns true, for at most usec microseconds, and
+// returns true if it did. Callers busy poll before blocking, to avoid the
+// latency of sleeping and being woken up when an event is imminent.
+//
+// t yields the processor between calls to ready, stops busy polling after a
+// clock tick, and stops early if it is interrupted, so that it doesn't starve
+// other tasks or delay signals.
+func (t *Task) BusyPoll(usec uint32, ready func() bool) bool {
+	if usec == 0 {
+		return false
+	}
+	d := time.Duration(usec) * time.Microsecond
+	if d > maxBusyPoll {
+		d = maxBusyPoll
+	}
+	deadline := time.Now().Add(d)
+	for {
+		if ready() {
+			busyPollHits.Increment()
+			return true
+		}
+		if t.Interrupted() || !time.Now().Before(deadline) {
+			busyPollSleeps.Increment()
+			return false
+		}
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/shrinker"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// cacheShrinkInterval is the minimum interval between consecutive shrinks of
+// caches under memory pressure. Shrinking caches doesn't always reduce the
+// memory allocated from the MemoryFile, e.g. for dentries, so pressure may
+// persist after a shrink.
+const cacheShrinkInterval = time.Second
+
+// cachePressureState is the state of the cache shrinker.
+type cachePressureState struct {
+	mu sync.Mutex
+
+	// limit is the limit passed to EnableCacheShrinker. limit is protected by
+	// mu.
+	limit uint64
+
+	// last is the time of the last shrink. last is protected by mu.
+	last time.Time
+}
+
+// EnableCacheShrinker makes k shrink discardable sentry caches (see package
+// shrinker) when more than 7/8 of limit bytes are allocated from its
+// MemoryFile, down to 3/4 of limit, and when the host signals memory
+// pressure. A limit of 0 means that the memory limit is unknown, in which case
+// caches are only shrunk due to host memory pressure.
+func (k *Kernel) EnableCacheShrinker(limit uint64) {
+	k.cachePressure.mu.Lock()
+	k.cachePressure.limit = limit
+	k.cachePressure.mu.Unlock()
+	k.mf.SetPressureCallback(limit-limit/8, k.shrinkCaches)
+	log.Infof("Cache shrinker enabled with a limit of %d bytes", limit)
+}
+
+// shrinkCaches is called by k's MemoryFile under memory pressure.
+func (k *Kernel) shrinkCaches() {
+	cp := &k.cachePressure
+	cp.mu.Lock()
+	if now := time.Now(); now.Sub(cp.last) >= cacheShrinkInterval {
+		cp.last = now
+	} else {
+		cp.mu.Unlock()
+		return
+	}
+	limit := cp.limit
+	cp.mu.Unlock()
+
+	// Under host memory pressure, shed a quarter of the caches. When close to
+	// the limit, shed enough to get back to the target, if that's more.
+	want := shrinker.TotalBytes() / 4
+	if limit != 0 {
+		target := limit - limit/4
+		if _, allocated := k.mf.Limit(); allocated > target && allocated-target > want {
+			want = allocated - target
+		}
+	}
+	freed := shrinker.Shrink(k.SupervisorContext(), want)
+	log.Debugf("Shrank caches by %d bytes (wanted %d) under memory pressure", freed, want)
+}
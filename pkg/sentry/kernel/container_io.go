@@ -0,0 +1,59 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// containerIOState tracks the file I/O of each container.
+//
+// +stateify savable
+type containerIOState struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// containers maps container IDs to their file I/O accounting.
+	// containers is protected by mu.
+	containers map[string]*usage.ContainerIO
+}
+
+// ContainerIO returns the file I/O accounting of the container with the given
+// ID, creating it if it doesn't exist.
+func (k *Kernel) ContainerIO(cid string) *usage.ContainerIO {
+	k.containerIO.mu.Lock()
+	defer k.containerIO.mu.Unlock()
+	c, ok := k.containerIO.containers[cid]
+	if !ok {
+		if k.containerIO.containers == nil {
+			k.containerIO.containers = make(map[string]*usage.ContainerIO)
+		}
+		c = &usage.ContainerIO{}
+		k.containerIO.containers[cid] = c
+	}
+	return c
+}
+
+// ContainerIOs returns the file I/O accounting of all containers that have
+// been created, keyed by container ID.
+func (k *Kernel) ContainerIOs() map[string]*usage.ContainerIO {
+	k.containerIO.mu.Lock()
+	defer k.containerIO.mu.Unlock()
+	cs := make(map[string]*usage.ContainerIO, len(k.containerIO.containers))
+	for cid, c := range k.containerIO.containers {
+		cs[cid] = c
+	}
+	return cs
+}
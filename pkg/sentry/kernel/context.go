@@ -15,7 +15,10 @@
 package kernel
 
 import (
+	"io"
+
 	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/ipc"
 )
 
@@ -38,6 +41,10 @@ const (
 
 	// CtxUTSNamespace is a Context.Value key for a UTSNamespace.
 	CtxUTSNamespace
+
+	// CtxRandom is a Context.Value key for the io.Reader that random bytes
+	// should be read from.
+	CtxRandom
 )
 
 // ContextCanTrace returns true if ctx is permitted to trace t, in the same sense
@@ -86,6 +93,16 @@ func IPCNamespaceFromContext(ctx context.Context) *IPCNamespace {
 	return nil
 }
 
+// RandomFromContext returns the io.Reader that ctx should read random bytes
+// from, which is the task's random number generator on task goroutines, and
+// rand.Reader otherwise.
+func RandomFromContext(ctx context.Context) io.Reader {
+	if v := ctx.Value(CtxRandom); v != nil {
+		return v.(io.Reader)
+	}
+	return rand.Reader
+}
+
 // TaskFromContext returns the Task associated with ctx, or nil if there is no
 // such Task.
 func TaskFromContext(ctx context.Context) *Task {
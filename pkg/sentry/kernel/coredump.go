@@ -0,0 +1,583 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// CorePattern returns the template for the names of core dump files, as in
+// /proc/sys/kernel/core_pattern.
+func (k *Kernel) CorePattern() string {
+	k.corePatternMu.Lock()
+	defer k.corePatternMu.Unlock()
+	return k.corePattern
+}
+
+// SetCorePattern sets the template for the names of core dump files. If
+// pattern is empty, core dumps are disabled.
+func (k *Kernel) SetCorePattern(pattern string) {
+	k.corePatternMu.Lock()
+	defer k.corePatternMu.Unlock()
+	k.corePattern = pattern
+}
+
+// coreDumpStop is a TaskStop that a task sets on itself when it wants to dump
+// core and is waiting for the other tasks in its thread group to exit first.
+//
+// +stateify savable
+type coreDumpStop struct{}
+
+// Killable implements TaskStop.Killable.
+func (*coreDumpStop) Killable() bool { return true }
+
+// groupExitWithCoreDump initiates the exit of t's thread group due to the
+// signal described by info, whose default action is to terminate the process
+// and dump core. If core dumps are enabled, t dumps core once all other tasks
+// in its thread group have exited, so that their state doesn't change during
+// the dump. Compare Linux's fs/coredump.c:do_coredump() => coredump_wait().
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) groupExitWithCoreDump(info *linux.SignalInfo) taskRunState {
+	dump := t.k.CorePattern() != ""
+	t.tg.pidns.owner.mu.Lock()
+	defer t.tg.pidns.owner.mu.Unlock()
+	t.tg.signalHandlers.mu.Lock()
+	defer t.tg.signalHandlers.mu.Unlock()
+	if t.tg.exiting || t.tg.execing != nil {
+		// We lost to a racing group exit, kill, or exec from another thread,
+		// so the thread group isn't exiting because of info.
+		dump = false
+	}
+	t.prepareGroupExitLocked(linux.WaitStatusTerminationSignal(linux.Signal(info.Signo)))
+	if !dump {
+		return (*runExit)(nil)
+	}
+	t.tg.coreDumping = t
+	if t.tg.liveTasks > 1 {
+		// The last sibling to exit will wake t.
+		t.beginInternalStopLocked((*coreDumpStop)(nil))
+	}
+	return &runCoreDump{info: *info}
+}
+
+// The runCoreDump state dumps core after all siblings of a task that received
+// a core-dumping signal have exited, then continues its exit.
+//
+// +stateify savable
+type runCoreDump struct {
+	info linux.SignalInfo
+}
+
+func (r *runCoreDump) execute(t *Task) taskRunState {
+	t.tg.pidns.owner.mu.Lock()
+	t.tg.coreDumping = nil
+	t.tg.pidns.owner.mu.Unlock()
+	if t.killed() {
+		// We were killed while waiting for our siblings to exit.
+		return (*runExit)(nil)
+	}
+
+	name, err := t.dumpCore(&r.info)
+	if err != nil {
+		t.Infof("Failed to dump core: %v", err)
+		return (*runExit)(nil)
+	}
+	t.Infof("Dumped core to %q", name)
+
+	// Indicate that a core dump was produced in the thread group's exit
+	// status. No other tasks in the thread group can be running, so no one
+	// else can observe the change.
+	t.tg.pidns.owner.mu.Lock()
+	t.tg.signalHandlers.mu.Lock()
+	t.tg.exitStatus = t.tg.exitStatus.WithCoreDump()
+	for task := t.tg.tasks.Front(); task != nil; task = task.Next() {
+		task.exitStatus = t.tg.exitStatus
+	}
+	t.tg.signalHandlers.mu.Unlock()
+	t.tg.pidns.owner.mu.Unlock()
+	return (*runExit)(nil)
+}
+
+// dumpCore writes an ELF core dump of t's thread group, as a result of the
+// signal described by info, and returns the name of the core dump file.
+//
+// Preconditions:
+//   - The caller must be running on the task goroutine.
+//   - All other tasks in t's thread group have exited.
+func (t *Task) dumpCore(info *linux.SignalInfo) (string, error) {
+	pattern := t.k.CorePattern()
+	if pattern == "" {
+		return "", fmt.Errorf("core dumps are disabled")
+	}
+	if strings.HasPrefix(pattern, "|") {
+		return "", fmt.Errorf("piping core dumps to a program is not supported")
+	}
+	m := t.MemoryManager()
+	if m.Dumpability() == mm.NotDumpable {
+		return "", fmt.Errorf("process is not dumpable")
+	}
+	limit := t.tg.limits.Get(limits.Core).Cur
+	if limit < hostarch.PageSize {
+		return "", fmt.Errorf("RLIMIT_CORE is %d", limit)
+	}
+	name := t.expandCorePattern(pattern, linux.Signal(info.Signo))
+	if name == "" {
+		return "", fmt.Errorf("core_pattern %q expands to an empty name", pattern)
+	}
+
+	w, err := t.openCoreDumpFile(name, limit)
+	if err != nil {
+		return name, err
+	}
+	defer w.fd.DecRef(t)
+
+	// Since the dump is written sequentially, the notes and headers are built
+	// first to determine the offsets of segment contents.
+	notes := t.coreDumpNotes(info)
+	segs := m.CoreDumpSegments()
+	var (
+		ehdr linux.ElfHeader64
+		phdr linux.ElfProg64
+	)
+	phnum := 1 + len(segs)
+	if phnum >= pnXNum {
+		return name, fmt.Errorf("too many mappings: %d", len(segs))
+	}
+	notesOff := uint64(ehdr.SizeBytes() + phnum*phdr.SizeBytes())
+	dataOff, _ := hostarch.PageRoundUp(notesOff + uint64(len(notes)))
+
+	var machine elf.Machine
+	switch t.Arch().Arch() {
+	case arch.AMD64:
+		machine = elf.EM_X86_64
+	case arch.ARM64:
+		machine = elf.EM_AARCH64
+	default:
+		return name, fmt.Errorf("unsupported architecture %v", t.Arch().Arch())
+	}
+	copy(ehdr.Ident[:], elf.ELFMAG)
+	ehdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	ehdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	ehdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	ehdr.Ident[elf.EI_OSABI] = byte(elf.ELFOSABI_NONE)
+	ehdr.Type = uint16(elf.ET_CORE)
+	ehdr.Machine = uint16(machine)
+	ehdr.Version = uint32(elf.EV_CURRENT)
+	ehdr.Phoff = uint64(ehdr.SizeBytes())
+	ehdr.Ehsize = uint16(ehdr.SizeBytes())
+	ehdr.Phentsize = uint16(phdr.SizeBytes())
+	ehdr.Phnum = uint16(phnum)
+
+	hdrs := make([]byte, notesOff, dataOff)
+	ehdr.MarshalBytes(hdrs)
+	phdrs := hdrs[ehdr.SizeBytes():]
+	phdr = linux.ElfProg64{
+		Type:   uint32(elf.PT_NOTE),
+		Off:    notesOff,
+		Filesz: uint64(len(notes)),
+		Align:  4,
+	}
+	phdr.MarshalBytes(phdrs)
+	phdrs = phdrs[phdr.SizeBytes():]
+	off := dataOff
+	for _, seg := range segs {
+		var flags elf.ProgFlag
+		if seg.Perms.Read {
+			flags |= elf.PF_R
+		}
+		if seg.Perms.Write {
+			flags |= elf.PF_W
+		}
+		if seg.Perms.Execute {
+			flags |= elf.PF_X
+		}
+		phdr = linux.ElfProg64{
+			Type:   uint32(elf.PT_LOAD),
+			Flags:  uint32(flags),
+			Off:    off,
+			Vaddr:  uint64(seg.Start),
+			Filesz: seg.DumpSize,
+			Memsz:  uint64(seg.End - seg.Start),
+			Align:  hostarch.PageSize,
+		}
+		phdr.MarshalBytes(phdrs)
+		phdrs = phdrs[phdr.SizeBytes():]
+		off += seg.DumpSize
+	}
+	hdrs = append(hdrs, notes...)
+	hdrs = hdrs[:dataOff]
+	if err := w.writeAt(hdrs, 0); err != nil {
+		return name, err
+	}
+
+	// Write segment contents. Pages that have never been faulted in are left
+	// as holes in the file.
+	const chunkPages = 64
+	chunk := make([]byte, 0, chunkPages*hostarch.PageSize)
+	var chunkOff uint64
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		err := w.writeAt(chunk, chunkOff)
+		chunk = chunk[:0]
+		if err == nil && t.killed() {
+			err = linuxerr.ErrInterrupted
+		}
+		return err
+	}
+	off = dataOff
+	for _, seg := range segs {
+		end := seg.Start + hostarch.Addr(seg.DumpSize)
+		for addr := seg.Start; addr < end; addr += hostarch.PageSize {
+			page := chunk[len(chunk) : len(chunk)+hostarch.PageSize]
+			if m.ReadCoreDumpPage(t, addr, page) {
+				if len(chunk) == 0 {
+					chunkOff = off
+				}
+				chunk = chunk[:len(chunk)+hostarch.PageSize]
+				if len(chunk) == cap(chunk) {
+					if err := flush(); err != nil {
+						return name, err
+					}
+				}
+			} else if err := flush(); err != nil {
+				return name, err
+			}
+			off += hostarch.PageSize
+		}
+	}
+	if err := flush(); err != nil {
+		return name, err
+	}
+	// Extend the file over any trailing hole.
+	if err := w.fd.SetStat(t, vfs.SetStatOptions{
+		Stat: linux.Statx{
+			Mask: linux.STATX_SIZE,
+			Size: off,
+		},
+	}); err != nil {
+		return name, err
+	}
+	return name, nil
+}
+
+// expandCorePattern returns the name of the core dump file for t as a result
+// of signal sig, given core_pattern pattern.
+func (t *Task) expandCorePattern(pattern string, sig linux.Signal) string {
+	return formatCorePattern(pattern, func(spec byte) string {
+		switch spec {
+		case 'p':
+			return strconv.Itoa(int(t.tg.pidns.IDOfThreadGroup(t.tg)))
+		case 'P':
+			return strconv.Itoa(int(t.k.tasks.Root.IDOfThreadGroup(t.tg)))
+		case 'i':
+			return strconv.Itoa(int(t.tg.pidns.IDOfTask(t)))
+		case 'I':
+			return strconv.Itoa(int(t.k.tasks.Root.IDOfTask(t)))
+		case 'u':
+			return strconv.FormatUint(uint64(t.Credentials().RealKUID), 10)
+		case 'g':
+			return strconv.FormatUint(uint64(t.Credentials().RealKGID), 10)
+		case 's':
+			return strconv.Itoa(int(sig))
+		case 't':
+			return strconv.FormatInt(t.k.RealtimeClock().Now().Seconds(), 10)
+		case 'h':
+			return strings.ReplaceAll(t.UTSNamespace().HostName(), "/", "!")
+		case 'e':
+			return strings.ReplaceAll(t.Name(), "/", "!")
+		default:
+			return ""
+		}
+	})
+}
+
+// formatCorePattern returns pattern with each "%" specifier replaced by
+// expand(specifier), except that "%%" is replaced by "%". Compare Linux's
+// fs/coredump.c:format_corename().
+func formatCorePattern(pattern string, expand func(spec byte) string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		if i == len(pattern) {
+			// A trailing "%" is dropped.
+			break
+		}
+		if pattern[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		b.WriteString(expand(pattern[i]))
+	}
+	return b.String()
+}
+
+// coreDumpWriter writes a core dump file.
+type coreDumpWriter struct {
+	t  *Task
+	fd *vfs.FileDescription
+
+	// limit is the maximum number of bytes that may be written, from
+	// RLIMIT_CORE.
+	limit uint64
+
+	// written is the number of bytes written.
+	written uint64
+}
+
+// openCoreDumpFile opens the core dump file at the given path, relative to
+// t's working directory. Compare Linux's fs/coredump.c:do_coredump().
+func (t *Task) openCoreDumpFile(name string, limit uint64) (*coreDumpWriter, error) {
+	root := t.FSContext().RootDirectoryVFS2()
+	defer root.DecRef(t)
+	cwd := t.FSContext().WorkingDirectoryVFS2()
+	defer cwd.DecRef(t)
+	fd, err := t.k.VFS().OpenAt(t, t.Credentials(), &vfs.PathOperation{
+		Root:  root,
+		Start: cwd,
+		Path:  fspath.Parse(name),
+	}, &vfs.OpenOptions{
+		Flags: linux.O_WRONLY | linux.O_CREAT | linux.O_NOFOLLOW | linux.O_LARGEFILE,
+		Mode:  0600,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", name, err)
+	}
+	// Only dump core to regular files, which are truncated after opening
+	// rather than by O_TRUNC to avoid truncating other kinds of files.
+	stat, err := fd.Stat(t, vfs.StatOptions{Mask: linux.STATX_TYPE})
+	if err == nil && stat.Mode&linux.S_IFMT != linux.S_IFREG {
+		err = fmt.Errorf("%q is not a regular file", name)
+	}
+	if err == nil {
+		err = fd.SetStat(t, vfs.SetStatOptions{
+			Stat: linux.Statx{
+				Mask: linux.STATX_SIZE,
+				Size: 0,
+			},
+		})
+	}
+	if err != nil {
+		fd.DecRef(t)
+		return nil, err
+	}
+	return &coreDumpWriter{
+		t:     t,
+		fd:    fd,
+		limit: limit,
+	}, nil
+}
+
+// writeAt writes b to the core dump file at offset off.
+func (w *coreDumpWriter) writeAt(b []byte, off uint64) error {
+	if w.written+uint64(len(b)) > w.limit {
+		return fmt.Errorf("core dump exceeds RLIMIT_CORE (%d bytes)", w.limit)
+	}
+	for len(b) > 0 {
+		n, err := w.fd.PWrite(w.t, usermem.BytesIOSequence(b), int64(off), vfs.WriteOptions{})
+		w.written += uint64(n)
+		off += uint64(n)
+		b = b[n:]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pnXNum is the reserved value of e_phnum that indicates that the number of
+// program headers is stored elsewhere, which is not supported.
+const pnXNum = 0xffff
+
+// coreDumpMaxRegSetSize is the maximum size of a register set in a core
+// dump.
+const coreDumpMaxRegSetSize = hostarch.PageSize
+
+// coreDumpNotes returns the contents of the PT_NOTE segment of a core dump of
+// t's thread group as a result of the signal described by info. Compare
+// Linux's fs/binfmt_elf.c:fill_note_info().
+func (t *Task) coreDumpNotes(info *linux.SignalInfo) []byte {
+	// t is the first thread described by the dump.
+	threads := []*Task{t}
+	t.tg.pidns.owner.mu.RLock()
+	for task := t.tg.tasks.Front(); task != nil; task = task.Next() {
+		if task != t {
+			threads = append(threads, task)
+		}
+	}
+	t.tg.pidns.owner.mu.RUnlock()
+
+	var notes bytes.Buffer
+	for i, thread := range threads {
+		var fpregs bytes.Buffer
+		if _, err := thread.Arch().PtraceGetRegSet(linux.NT_PRFPREG, &fpregs, coreDumpMaxRegSetSize, t.k.FeatureSet()); err != nil {
+			fpregs.Reset()
+		}
+		appendCoreDumpNote(&notes, linux.NT_PRSTATUS, t.coreDumpPrstatus(thread, info, fpregs.Len() != 0))
+		if i == 0 {
+			appendCoreDumpNote(&notes, linux.NT_PRPSINFO, t.coreDumpPrpsinfo())
+			siginfo := make([]byte, info.SizeBytes())
+			info.MarshalBytes(siginfo)
+			appendCoreDumpNote(&notes, linux.NT_SIGINFO, siginfo)
+			appendCoreDumpNote(&notes, linux.NT_AUXV, t.coreDumpAuxv())
+		}
+		if fpregs.Len() != 0 {
+			appendCoreDumpNote(&notes, linux.NT_PRFPREG, fpregs.Bytes())
+		}
+	}
+	return notes.Bytes()
+}
+
+// appendCoreDumpNote appends an ELF note with the given type and descriptor,
+// and the owner name "CORE", to buf.
+func appendCoreDumpNote(buf *bytes.Buffer, typ uint32, desc []byte) {
+	const name = "CORE\x00"
+	hdr := linux.ElfNoteHeader64{
+		Namesz: uint32(len(name)),
+		Descsz: uint32(len(desc)),
+		Type:   typ,
+	}
+	b := make([]byte, hdr.SizeBytes())
+	hdr.MarshalBytes(b)
+	buf.Write(b)
+	buf.WriteString(name)
+	coreDumpNotePad(buf)
+	buf.Write(desc)
+	coreDumpNotePad(buf)
+}
+
+// coreDumpNotePad pads buf to the 4-byte alignment of ELF note fields.
+func coreDumpNotePad(buf *bytes.Buffer) {
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// coreDumpIDs returns the process, parent process, process group and session
+// IDs of thread in t's PID namespace.
+func (t *Task) coreDumpIDs(thread *Task) (pid, ppid, pgrp, sid int32) {
+	pidns := t.tg.pidns
+	pid = int32(pidns.IDOfTask(thread))
+	if parent := thread.Parent(); parent != nil {
+		ppid = int32(pidns.IDOfThreadGroup(parent.tg))
+	}
+	if pg := thread.tg.ProcessGroup(); pg != nil {
+		pgrp = int32(pidns.IDOfProcessGroup(pg))
+	}
+	if s := thread.tg.Session(); s != nil {
+		sid = int32(pidns.IDOfSession(s))
+	}
+	return
+}
+
+// coreDumpPrstatus returns the NT_PRSTATUS note descriptor for thread, a
+// struct elf_prstatus.
+func (t *Task) coreDumpPrstatus(thread *Task, info *linux.SignalInfo, fpvalid bool) []byte {
+	var regs bytes.Buffer
+	if _, err := thread.Arch().PtraceGetRegSet(linux.NT_PRSTATUS, &regs, coreDumpMaxRegSetSize, t.k.FeatureSet()); err != nil {
+		t.Debugf("Failed to get registers of thread %d for core dump: %v", t.tg.pidns.IDOfTask(thread), err)
+	}
+	cpu := thread.CPUStats()
+	cchild := t.tg.JoinedChildCPUStats()
+	hdr := linux.ElfPrstatusHeader{
+		Signo:   info.Signo,
+		Code:    info.Code,
+		Errno:   info.Errno,
+		Cursig:  int16(info.Signo),
+		Sigpend: uint64(thread.PendingSignals()),
+		Sighold: uint64(thread.SignalMask()),
+		Utime:   linux.DurationToTimeval(cpu.UserTime),
+		Stime:   linux.DurationToTimeval(cpu.SysTime),
+		Cutime:  linux.DurationToTimeval(cchild.UserTime),
+		Cstime:  linux.DurationToTimeval(cchild.SysTime),
+	}
+	hdr.Pid, hdr.Ppid, hdr.Pgrp, hdr.Sid = t.coreDumpIDs(thread)
+
+	// struct elf_prstatus ends with int pr_fpvalid, and is padded to 8 bytes.
+	size := hdr.SizeBytes() + regs.Len() + 4
+	size = (size + 7) &^ 7
+	desc := make([]byte, size)
+	hdr.MarshalBytes(desc)
+	copy(desc[hdr.SizeBytes():], regs.Bytes())
+	if fpvalid {
+		hostarch.ByteOrder.PutUint32(desc[hdr.SizeBytes()+regs.Len():], 1)
+	}
+	return desc
+}
+
+// coreDumpPrpsinfo returns the NT_PRPSINFO note descriptor for t's thread
+// group, a struct elf_prpsinfo.
+func (t *Task) coreDumpPrpsinfo() []byte {
+	creds := t.Credentials()
+	psinfo := linux.ElfPrpsinfo{
+		Sname: 'R',
+		Nice:  int8(t.Niceness()),
+		UID:   uint32(creds.RealKUID.In(creds.UserNamespace).OrOverflow()),
+		GID:   uint32(creds.RealKGID.In(creds.UserNamespace).OrOverflow()),
+	}
+	psinfo.Pid, psinfo.Ppid, psinfo.Pgrp, psinfo.Sid = t.coreDumpIDs(t)
+	psinfo.Pid = int32(t.tg.pidns.IDOfThreadGroup(t.tg))
+	copy(psinfo.Fname[:len(psinfo.Fname)-1], t.Name())
+
+	// Include the beginning of the process' arguments, separated by spaces.
+	m := t.MemoryManager()
+	args := psinfo.Psargs[:len(psinfo.Psargs)-1]
+	if argvLen := int(m.ArgvEnd() - m.ArgvStart()); argvLen >= 0 && argvLen < len(args) {
+		args = args[:argvLen]
+	}
+	n, _ := m.CopyIn(t, m.ArgvStart(), args, usermem.IOOpts{IgnorePermissions: true})
+	args = args[:n]
+	for i := range args {
+		if args[i] == 0 {
+			args[i] = ' '
+		}
+	}
+
+	desc := make([]byte, psinfo.SizeBytes())
+	psinfo.MarshalBytes(desc)
+	return desc
+}
+
+// coreDumpAuxv returns the NT_AUXV note descriptor for t's thread group, the
+// auxiliary vector terminated by AT_NULL.
+func (t *Task) coreDumpAuxv() []byte {
+	auxv := t.MemoryManager().Auxv()
+	desc := make([]byte, 16*(len(auxv)+1))
+	for i, e := range auxv {
+		hostarch.ByteOrder.PutUint64(desc[16*i:], e.Key)
+		hostarch.ByteOrder.PutUint64(desc[16*i+8:], uint64(e.Value))
+	}
+	return desc
+}
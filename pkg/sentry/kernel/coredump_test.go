@@ -0,0 +1,49 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+)
+
+func TestFormatCorePattern(t *testing.T) {
+	expand := func(spec byte) string {
+		switch spec {
+		case 'p':
+			return "123"
+		case 'e':
+			return "a!b"
+		default:
+			return ""
+		}
+	}
+	for _, test := range []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "", want: ""},
+		{pattern: "core", want: "core"},
+		{pattern: "/cores/core.%e.%p", want: "/cores/core.a!b.123"},
+		{pattern: "%%p", want: "%p"},
+		{pattern: "core%", want: "core"},
+		{pattern: "core.%z.%p", want: "core..123"},
+	} {
+		t.Run(test.pattern, func(t *testing.T) {
+			if got := formatCorePattern(test.pattern, expand); got != test.want {
+				t.Errorf("formatCorePattern(%q) = %q, want %q", test.pattern, got, test.want)
+			}
+		})
+	}
+}
@@ -301,7 +301,7 @@ func (f *FDTable) NewFDs(ctx context.Context, minFD int32, files []*fs.File, fla
 	// Ensure we don't get past the provided limit.
 	if limitSet := limits.FromContext(ctx); limitSet != nil {
 		lim := limitSet.Get(limits.NumberOfFiles)
-		if lim.Cur != limits.Infinity {
+		if lim.Cur < uint64(MaxFdLimit) {
 			end = int32(lim.Cur)
 		}
 		if minFD+int32(len(files)) > end {
@@ -378,7 +378,7 @@ func (f *FDTable) NewFDsVFS2(ctx context.Context, minFD int32, files []*vfs.File
 	// Ensure we don't get past the provided limit.
 	if limitSet := limits.FromContext(ctx); limitSet != nil {
 		lim := limitSet.Get(limits.NumberOfFiles)
-		if lim.Cur != limits.Infinity {
+		if lim.Cur < uint64(MaxFdLimit) {
 			end = int32(lim.Cur)
 		}
 		if minFD >= end {
@@ -484,10 +484,12 @@ func (f *FDTable) newFDAt(ctx context.Context, fd int32, file *fs.File, fileVFS2
 		return nil, nil, unix.EBADF
 	}
 
-	// Check the limit for the provided file.
+	// Check the limit for the provided file. Unlike when allocating an FD,
+	// Linux returns EBADF for an explicit FD beyond RLIMIT_NOFILE; see
+	// fs/file.c:ksys_dup3() and replace_fd().
 	if limitSet := limits.FromContext(ctx); limitSet != nil {
 		if lim := limitSet.Get(limits.NumberOfFiles); lim.Cur != limits.Infinity && uint64(fd) >= lim.Cur {
-			return nil, nil, unix.EMFILE
+			return nil, nil, unix.EBADF
 		}
 	}
 
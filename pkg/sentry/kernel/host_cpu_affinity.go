@@ -0,0 +1,146 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/goid"
+	"gvisor.dev/gvisor/pkg/sentry/hostcpu"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+)
+
+// Host CPU affinity passthrough.
+//
+// If InitKernelArgs.HostCPUs is set, application CPU i is backed by host CPU
+// HostCPUs[i]. Each task goroutine is then locked to its own host thread for
+// its whole lifetime, and that thread's host affinity follows the task's
+// allowed CPU mask, so that tasks pinned to distinct CPUs by
+// sched_setaffinity(2) really run on distinct host CPUs. Tasks using
+// restartable sequences are instead pinned to the host CPU backing the
+// virtual CPU they hold (see rseqCPUSet), so that their rseq cpu_id is also
+// the CPU they run on.
+//
+// Affinity changes are applied by the task goroutine before it next executes
+// application code, since a thread's host affinity can only be changed
+// cheaply by the thread itself.
+
+// lockHostThread locks the task goroutine to its host thread if host CPU
+// affinity passthrough is enabled. The thread is never unlocked, so that it
+// exits with the task goroutine instead of running other goroutines with the
+// task's affinity.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) lockHostThread() {
+	if t.k.hostCPUs != nil {
+		runtime.LockOSThread()
+	}
+}
+
+// applyHostCPUAffinity sets the host affinity of the thread executing the
+// task goroutine from t's allowed CPU mask, or to the host CPU backing the
+// virtual CPU held by t, if it has changed since it was last applied.
+//
+// Preconditions:
+//   - The caller must be running on the task goroutine.
+//   - t.k.hostCPUs != nil.
+func (t *Task) applyHostCPUAffinity() {
+	pinned := t.rseqHeldCPU
+	if t.hostAffinityApplied.Load() != 0 && t.hostAffinityCPU == pinned {
+		return
+	}
+	// Mark the affinity applied before reading allowedCPUMask, so that a
+	// concurrent SetCPUMask is applied next time.
+	t.hostAffinityApplied.Store(1)
+	t.hostAffinityCPU = pinned
+
+	var set unix.CPUSet
+	if pinned >= 0 {
+		set.Set(int(t.k.hostCPUs[pinned]))
+	} else {
+		t.mu.Lock()
+		t.allowedCPUMask.ForEachCPU(func(cpu uint) {
+			if cpu < uint(len(t.k.hostCPUs)) {
+				set.Set(int(t.k.hostCPUs[cpu]))
+			}
+		})
+		t.mu.Unlock()
+	}
+	err := unix.SchedSetaffinity(0, &set)
+	if err == nil {
+		return
+	}
+	if err != unix.EINVAL {
+		t.Warningf("Failed to set host CPU affinity to %v: %v", set, err)
+		return
+	}
+	t.hostCPUAffinityFallback()
+}
+
+// hostCPUAffinityFallback handles a task whose allowed CPUs have all left
+// the sandbox's host cpuset. As in Linux's select_fallback_rq(), the task is
+// allowed to run on every CPU that remains in the cpuset.
+//
+// Preconditions: Same as applyHostCPUAffinity.
+func (t *Task) hostCPUAffinityFallback() {
+	var set unix.CPUSet
+	for _, cpu := range t.k.hostCPUs {
+		set.Set(int(cpu))
+	}
+	// The host restricts set to the cpuset, so this only fails if no CPU of
+	// the sandbox remains.
+	if err := unix.SchedSetaffinity(0, &set); err != nil {
+		t.Warningf("Failed to set host CPU affinity to any sandbox CPU: %v", err)
+		return
+	}
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		t.Warningf("Failed to get host CPU affinity: %v", err)
+		return
+	}
+	mask := sched.NewCPUSet(t.k.ApplicationCores())
+	for i, cpu := range t.k.hostCPUs {
+		if set.IsSet(int(cpu)) {
+			mask.Set(uint(i))
+		}
+	}
+	if mask.NumCPUs() == 0 {
+		return
+	}
+	t.Infof("Allowed CPUs left the host cpuset, falling back to %v", mask)
+	// SetCPUMask marks the affinity unapplied; it is reapplied, with the
+	// widened mask, before the task next executes application code.
+	if err := t.SetCPUMask(mask); err != nil {
+		t.Warningf("Failed to set CPU mask to %v: %v", mask, err)
+	}
+}
+
+// hostCPU returns the application CPU backed by the host CPU executing the
+// task goroutine, or -1 if that host CPU doesn't back any application CPU.
+//
+// Preconditions: t.k.hostCPUs != nil.
+func (t *Task) hostCPU() int32 {
+	if t.goid.Load() != goid.Get() {
+		// Only the task goroutine is locked to the task's host thread.
+		return -1
+	}
+	cpu := uint(hostcpu.GetCPU())
+	for i, hostCPU := range t.k.hostCPUs {
+		if hostCPU == cpu {
+			return int32(i)
+		}
+	}
+	return -1
+}
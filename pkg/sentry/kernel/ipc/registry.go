@@ -15,6 +15,8 @@
 package ipc
 
 import (
+	"sort"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -162,6 +164,18 @@ func (r *Registry) ForAllObjects(f func(o Mechanism)) {
 	}
 }
 
+// Objects returns all registered objects, sorted by ID.
+func (r *Registry) Objects() []Mechanism {
+	objs := make([]Mechanism, 0, len(r.objects))
+	for _, o := range r.objects {
+		objs = append(objs, o)
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].Object().ID < objs[j].Object().ID
+	})
+	return objs
+}
+
 // FindByID returns the mechanism with the given ID, nil if non exists.
 func (r *Registry) FindByID(id ID) Mechanism {
 	return r.objects[id]
@@ -190,6 +204,18 @@ func (r *Registry) ObjectCount() int {
 	return len(r.objects)
 }
 
+// HighestID returns the highest ID of all registered objects, or 0 if there
+// are none.
+func (r *Registry) HighestID() ID {
+	var highest ID
+	for id := range r.objects {
+		if id > highest {
+			highest = id
+		}
+	}
+	return highest
+}
+
 // LastIDUsed returns the last used ID.
 func (r *Registry) LastIDUsed() ID {
 	return r.lastIDUsed
@@ -48,6 +48,7 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	rpb "gvisor.dev/gvisor/pkg/sentry/arch/registers_go_proto"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/fsbridge"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/pipefs"
@@ -88,6 +89,10 @@ var LISAFSEnabled = false
 // easy access everywhere. To be removed once FUSE is completed.
 var FUSEEnabled = false
 
+// MemfdSecretEnabled is set to true when memfd_secret(2) is enabled. Added as
+// a global to allow easy access from the syscall table.
+var MemfdSecretEnabled = false
+
 // userCounters is a set of user counters.
 //
 // +stateify savable
@@ -102,7 +107,7 @@ func (uc *userCounters) incRLimitNProc(ctx context.Context) error {
 	lim := limits.FromContext(ctx).Get(limits.ProcessCount)
 	creds := auth.CredentialsFromContext(ctx)
 	nproc := uc.rlimitNProc.Add(1)
-	if nproc > lim.Cur &&
+	if nproc > lim.Cur && uc.uid != auth.RootKUID &&
 		!creds.HasCapability(linux.CAP_SYS_ADMIN) &&
 		!creds.HasCapability(linux.CAP_SYS_RESOURCE) {
 		uc.rlimitNProc.Add(^uint64(0))
@@ -116,6 +121,12 @@ func (uc *userCounters) decRLimitNProc() {
 	uc.rlimitNProc.Add(^uint64(0))
 }
 
+// overRLimitNProc returns true if the rlimitNProc counter exceeds the
+// RLIMIT_NPROC of ctx.
+func (uc *userCounters) overRLimitNProc(ctx context.Context) bool {
+	return uc.rlimitNProc.Load() > limits.FromContext(ctx).Get(limits.ProcessCount).Cur
+}
+
 // Kernel represents an emulated Linux kernel. It must be initialized by calling
 // Init() or LoadFrom().
 //
@@ -146,18 +157,23 @@ type Kernel struct {
 	mf *pgalloc.MemoryFile `state:"nosave"`
 
 	// See InitKernelArgs for the meaning of these fields.
-	featureSet                  cpuid.FeatureSet
-	timekeeper                  *Timekeeper
-	tasks                       *TaskSet
-	rootUserNamespace           *auth.UserNamespace
-	rootNetworkNamespace        *inet.Namespace
-	applicationCores            uint
-	useHostCores                bool
-	extraAuxv                   []arch.AuxEntry
-	vdso                        *loader.VDSO
-	rootUTSNamespace            *UTSNamespace
-	rootIPCNamespace            *IPCNamespace
-	rootAbstractSocketNamespace *AbstractSocketNamespace
+	featureSet           cpuid.FeatureSet
+	timekeeper           *Timekeeper
+	tasks                *TaskSet
+	rootUserNamespace    *auth.UserNamespace
+	rootNetworkNamespace *inet.Namespace
+	useHostCores         bool
+	hostCPUs             []uint
+	extraAuxv            []arch.AuxEntry
+	vdso                 *loader.VDSO
+	rootUTSNamespace     *UTSNamespace
+	rootIPCNamespace     *IPCNamespace
+	rootTimeNamespace    *TimeNamespace
+
+	// applicationCores is the number of CPUs visible to sandboxed
+	// applications. It may be changed by SetApplicationCores while the
+	// kernel is running.
+	applicationCores atomicbitops.Uint32
 
 	// futexes is the "root" futex.Manager, from which all others are forked.
 	// This is necessary to ensure that shared futexes are coherent across all
@@ -283,6 +299,10 @@ type Kernel struct {
 	// syscall.
 	unimplementedSyscallEmitter eventchannel.Emitter `state:"nosave"`
 
+	// unimplementedSyscallObserver, if not nil, is notified of every
+	// unimplemented syscall. It is immutable after it is set.
+	unimplementedSyscallObserver UnimplementedSyscallObserver `state:"nosave"`
+
 	// SpecialOpts contains special kernel options.
 	SpecialOpts
 
@@ -325,6 +345,34 @@ type Kernel struct {
 	// YAMAPtraceScope is the current level of YAMA ptrace restrictions.
 	YAMAPtraceScope atomicbitops.Int32
 
+	// corePatternMu protects corePattern.
+	corePatternMu sync.Mutex `state:"nosave"`
+
+	// corePattern is the template for the names of core dump files, as in
+	// /proc/sys/kernel/core_pattern. If corePattern is empty, core dumps are
+	// disabled.
+	corePattern string
+
+	// pressure tracks pressure stall information for /proc/pressure.
+	pressure pressureState
+
+	// oom is the state of the OOM killer.
+	oom oomState
+
+	// cachePressure is the state of the cache shrinker.
+	cachePressure cachePressureState `state:"nosave"`
+
+	// busyRead and busyPoll are the values of /proc/sys/net/core/busy_read and
+	// /proc/sys/net/core/busy_poll in microseconds. See busy_poll.go.
+	busyRead atomicbitops.Uint32
+	busyPoll atomicbitops.Uint32
+
+	// containerIO tracks the file I/O of each container.
+	containerIO containerIOState
+
+	// rseqCPUs assigns virtual CPUs to tasks using restartable sequences.
+	rseqCPUs rseqCPUSet `state:"nosave"`
+
 	// cgroupRegistry contains the set of active cgroup controllers on the
 	// system. It is controller by cgroupfs. Nil if cgroupfs is unavailable on
 	// the system.
@@ -362,6 +410,13 @@ type InitKernelArgs struct {
 	// will be overridden.
 	UseHostCores bool
 
+	// If HostCPUs is not nil, application CPU i is backed by host CPU
+	// HostCPUs[i]: task goroutines execute on dedicated host threads whose
+	// affinity follows the tasks' allowed CPU masks. ApplicationCores is
+	// overridden by len(HostCPUs), and can't be changed afterwards.
+	// HostCPUs is incompatible with UseHostCores.
+	HostCPUs []uint
+
 	// ExtraAuxv contains additional auxiliary vector entries that are added to
 	// each process by the ELF loader.
 	ExtraAuxv []arch.AuxEntry
@@ -375,9 +430,6 @@ type InitKernelArgs struct {
 	// RootIPCNamespace is the root IPC namespace.
 	RootIPCNamespace *IPCNamespace
 
-	// RootAbstractSocketNamespace is the root Abstract Socket namespace.
-	RootAbstractSocketNamespace *AbstractSocketNamespace
-
 	// PIDNamespace is the root PID namespace.
 	PIDNamespace *PIDNamespace
 }
@@ -406,7 +458,7 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	k.rootUserNamespace = args.RootUserNamespace
 	k.rootUTSNamespace = args.RootUTSNamespace
 	k.rootIPCNamespace = args.RootIPCNamespace
-	k.rootAbstractSocketNamespace = args.RootAbstractSocketNamespace
+	k.rootTimeNamespace = NewRootTimeNamespace(k.timekeeper.monotonicClock, k.rootUserNamespace)
 	k.rootNetworkNamespace = args.RootNetworkNamespace
 	if k.rootNetworkNamespace == nil {
 		k.rootNetworkNamespace = inet.NewRootNamespace(nil, nil)
@@ -414,7 +466,7 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	k.runningTasksCond.L = &k.runningTasksMu
 	k.cpuClockTickerWakeCh = make(chan struct{}, 1)
 	k.cpuClockTickerStopCond.L = &k.runningTasksMu
-	k.applicationCores = args.ApplicationCores
+	k.applicationCores.Store(uint32(args.ApplicationCores))
 	if args.UseHostCores {
 		k.useHostCores = true
 		maxCPU, err := hostcpu.MaxPossibleCPU()
@@ -422,9 +474,22 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 			return fmt.Errorf("failed to get maximum CPU number: %v", err)
 		}
 		minAppCores := uint(maxCPU) + 1
-		if k.applicationCores < minAppCores {
-			log.Infof("UseHostCores enabled: increasing ApplicationCores from %d to %d", k.applicationCores, minAppCores)
-			k.applicationCores = minAppCores
+		if k.ApplicationCores() < minAppCores {
+			log.Infof("UseHostCores enabled: increasing ApplicationCores from %d to %d", k.ApplicationCores(), minAppCores)
+			k.applicationCores.Store(uint32(minAppCores))
+		}
+	}
+	if args.HostCPUs != nil {
+		if args.UseHostCores {
+			return fmt.Errorf("HostCPUs and UseHostCores are mutually exclusive")
+		}
+		if len(args.HostCPUs) == 0 {
+			return fmt.Errorf("HostCPUs must contain at least one CPU")
+		}
+		k.hostCPUs = append([]uint(nil), args.HostCPUs...)
+		if n := uint(len(args.HostCPUs)); k.ApplicationCores() != n {
+			log.Infof("HostCPUs set: changing ApplicationCores from %d to %d", k.ApplicationCores(), n)
+			k.applicationCores.Store(uint32(n))
 		}
 	}
 	k.extraAuxv = args.ExtraAuxv
@@ -477,7 +542,7 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 // SaveTo saves the state of k to w.
 //
 // Preconditions: The kernel must be paused throughout the call to SaveTo.
-func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
+func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer, mfOpts pgalloc.SaveOpts) error {
 	saveStart := time.Now()
 
 	// Do not allow other Kernel methods to affect it while it's being saved.
@@ -537,7 +602,7 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 
 	// Save the memory file's state.
 	memoryStart := time.Now()
-	if err := k.mf.SaveTo(ctx, w); err != nil {
+	if err := k.mf.SaveTo(ctx, w, mfOpts); err != nil {
 		return err
 	}
 	log.Infof("Memory save took [%s].", time.Since(memoryStart))
@@ -644,14 +709,14 @@ func (k *Kernel) invalidateUnsavableMappings(ctx context.Context) error {
 }
 
 // LoadFrom returns a new Kernel loaded from args.
-func (k *Kernel) LoadFrom(ctx context.Context, r wire.Reader, timeReady chan struct{}, net inet.Stack, clocks sentrytime.Clocks, vfsOpts *vfs.CompleteRestoreOptions) error {
+func (k *Kernel) LoadFrom(ctx context.Context, r wire.Reader, mfOpts pgalloc.LoadOpts, timeReady chan struct{}, net inet.Stack, clocks sentrytime.Clocks, vfsOpts *vfs.CompleteRestoreOptions) error {
 	loadStart := time.Now()
 
 	k.runningTasksCond.L = &k.runningTasksMu
 	k.cpuClockTickerWakeCh = make(chan struct{}, 1)
 	k.cpuClockTickerStopCond.L = &k.runningTasksMu
 
-	initAppCores := k.applicationCores
+	initAppCores := k.ApplicationCores()
 
 	// Load the pre-saved CPUID FeatureSet.
 	//
@@ -686,7 +751,7 @@ func (k *Kernel) LoadFrom(ctx context.Context, r wire.Reader, timeReady chan str
 
 	// Load the memory file's state.
 	memoryStart := time.Now()
-	if err := k.mf.LoadFrom(ctx, r); err != nil {
+	if err := k.mf.LoadFrom(ctx, r, mfOpts); err != nil {
 		return err
 	}
 	log.Infof("Memory load took [%s].", time.Since(memoryStart))
@@ -717,8 +782,8 @@ func (k *Kernel) LoadFrom(ctx context.Context, r wire.Reader, timeReady chan str
 	// assignments, we can't tolerate an increase in the number of host CPUs,
 	// which could result in getcpu(2) returning CPUs that applications expect
 	// not to exist.
-	if k.useHostCores && initAppCores > k.applicationCores {
-		return fmt.Errorf("UseHostCores enabled: can't increase ApplicationCores from %d to %d after restore", k.applicationCores, initAppCores)
+	if k.useHostCores && initAppCores > k.ApplicationCores() {
+		return fmt.Errorf("UseHostCores enabled: can't increase ApplicationCores from %d to %d after restore", k.ApplicationCores(), initAppCores)
 	}
 
 	return nil
@@ -780,12 +845,13 @@ type CreateProcessArgs struct {
 	// IPCNamespace is the initial IPC namespace.
 	IPCNamespace *IPCNamespace
 
+	// TimeNamespace is the initial time namespace. If nil, the root time
+	// namespace is used.
+	TimeNamespace *TimeNamespace
+
 	// PIDNamespace is the initial PID Namespace.
 	PIDNamespace *PIDNamespace
 
-	// AbstractSocketNamespace is the initial Abstract Socket namespace.
-	AbstractSocketNamespace *AbstractSocketNamespace
-
 	// MountNamespace optionally contains the mount namespace for this
 	// process. If nil, the init process's mount namespace is used.
 	//
@@ -795,6 +861,14 @@ type CreateProcessArgs struct {
 
 	// ContainerID is the container that the process belongs to.
 	ContainerID string
+
+	// LimitGroup optionally constrains the CPU and memory usage of the new
+	// process and its descendants.
+	LimitGroup *LimitGroup
+
+	// Personality is the initial personality of the new process, as for
+	// personality(2).
+	Personality uint32
 }
 
 // NewContext returns a context.Context that represents the task that will be
@@ -929,6 +1003,7 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 	fsContext := NewFSContext(root, wd, args.Umask)
 
 	tg := k.NewThreadGroup(nil, args.PIDNamespace, NewSignalHandlers(), linux.SIGCHLD, args.Limits)
+	tg.limitGroup = args.LimitGroup
 	cu := cleanup.Make(func() {
 		tg.Release(ctx)
 	})
@@ -967,6 +1042,9 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 		Envv:                args.Envv,
 		Features:            k.featureSet,
 	}
+	if args.TimeNamespace != nil {
+		loadArgs.DisableVDSOClocks = args.TimeNamespace.HasOffsets()
+	}
 
 	image, se := k.LoadTaskImage(ctx, loadArgs)
 	if se != nil {
@@ -979,20 +1057,21 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 
 	// Create the task.
 	config := &TaskConfig{
-		Kernel:                  k,
-		ThreadGroup:             tg,
-		TaskImage:               image,
-		FSContext:               fsContext,
-		FDTable:                 args.FDTable,
-		Credentials:             args.Credentials,
-		NetworkNamespace:        k.RootNetworkNamespace(),
-		AllowedCPUMask:          sched.NewFullCPUSet(k.applicationCores),
-		UTSNamespace:            args.UTSNamespace,
-		IPCNamespace:            args.IPCNamespace,
-		AbstractSocketNamespace: args.AbstractSocketNamespace,
-		MountNamespace:          mntns,
-		ContainerID:             args.ContainerID,
-		UserCounters:            k.GetUserCounters(args.Credentials.RealKUID),
+		Kernel:           k,
+		ThreadGroup:      tg,
+		TaskImage:        image,
+		FSContext:        fsContext,
+		FDTable:          args.FDTable,
+		Credentials:      args.Credentials,
+		NetworkNamespace: k.RootNetworkNamespace(),
+		AllowedCPUMask:   sched.NewFullCPUSet(k.ApplicationCores()),
+		UTSNamespace:     args.UTSNamespace,
+		IPCNamespace:     args.IPCNamespace,
+		TimeNamespace:    args.TimeNamespace,
+		MountNamespace:   mntns,
+		ContainerID:      args.ContainerID,
+		UserCounters:     k.GetUserCounters(args.Credentials.RealKUID),
+		Personality:      args.Personality,
 	}
 	config.NetworkNamespace.IncRef()
 	t, err := k.tasks.NewTask(ctx, config)
@@ -1240,6 +1319,29 @@ func (k *Kernel) Unpause() {
 	k.tasks.EndExternalStop()
 }
 
+// PauseContainer pauses all tasks that belong to the container with the given
+// ID, including tasks that it creates later, blocking until they are stopped.
+// Tasks in other containers, and the rest of the kernel, keep running.
+// Signals sent to paused tasks remain pending until UnpauseContainer is
+// called.
+func (k *Kernel) PauseContainer(cid string) {
+	k.extMu.Lock()
+	stopped := k.tasks.BeginContainerExternalStop(cid)
+	k.extMu.Unlock()
+	for _, t := range stopped {
+		t.waitGoroutineStoppedOrExited()
+	}
+}
+
+// UnpauseContainer ends the effect of a previous call to PauseContainer for
+// the same container. If UnpauseContainer is called without a matching
+// preceding call to PauseContainer, UnpauseContainer may panic.
+func (k *Kernel) UnpauseContainer(cid string) {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	k.tasks.EndContainerExternalStop(cid)
+}
+
 // SendExternalSignal injects a signal into the kernel.
 //
 // context is used only for debugging to describe how the signal was received.
@@ -1281,6 +1383,19 @@ func (k *Kernel) SendContainerSignal(cid string, info *linux.SignalInfo) error {
 	return lastErr
 }
 
+// ContainerHasLiveTasks returns true if any task in the container with the
+// given ID has not yet exited. Tasks that are zombies are not considered live.
+func (k *Kernel) ContainerHasLiveTasks(cid string) bool {
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	for t := range k.tasks.Root.tids {
+		if t.exitState < TaskExitZombie && t.ContainerID() == cid {
+			return true
+		}
+	}
+	return false
+}
+
 // RebuildTraceContexts rebuilds the trace context for all tasks.
 //
 // Unfortunately, if these are built while tracing is not enabled, then we will
@@ -1324,6 +1439,11 @@ func (k *Kernel) RootUserNamespace() *auth.UserNamespace {
 	return k.rootUserNamespace
 }
 
+// RootTimeNamespace returns the root TimeNamespace.
+func (k *Kernel) RootTimeNamespace() *TimeNamespace {
+	return k.rootTimeNamespace
+}
+
 // RootUTSNamespace returns the root UTSNamespace.
 func (k *Kernel) RootUTSNamespace() *UTSNamespace {
 	return k.rootUTSNamespace
@@ -1340,11 +1460,6 @@ func (k *Kernel) RootPIDNamespace() *PIDNamespace {
 	return k.tasks.Root
 }
 
-// RootAbstractSocketNamespace returns the root AbstractSocketNamespace.
-func (k *Kernel) RootAbstractSocketNamespace() *AbstractSocketNamespace {
-	return k.rootAbstractSocketNamespace
-}
-
 // RootNetworkNamespace returns the root network namespace, always non-nil.
 func (k *Kernel) RootNetworkNamespace() *inet.Namespace {
 	return k.rootNetworkNamespace
@@ -1367,7 +1482,71 @@ func (k *Kernel) TestOnlySetGlobalInit(tg *ThreadGroup) {
 // ApplicationCores returns the number of CPUs visible to sandboxed
 // applications.
 func (k *Kernel) ApplicationCores() uint {
-	return k.applicationCores
+	return uint(k.applicationCores.Load())
+}
+
+// NUMANodes returns the number of NUMA nodes visible to sandboxed
+// applications.
+func (k *Kernel) NUMANodes() int {
+	return k.mf.NUMANodes()
+}
+
+// NUMANodeOfCPU returns the NUMA node of the given application CPU.
+// Application CPUs are divided between NUMA nodes in contiguous blocks of
+// (approximately) equal size.
+func (k *Kernel) NUMANodeOfCPU(cpu uint) int {
+	cores := k.ApplicationCores()
+	return int(cpu % cores * uint(k.NUMANodes()) / cores)
+}
+
+// NUMANodeCPUs returns the range of application CPUs [start, end) in the given
+// NUMA node. The range is empty if there are more nodes than CPUs.
+func (k *Kernel) NUMANodeCPUs(node int) (start, end uint) {
+	cores, nodes := k.ApplicationCores(), uint(k.NUMANodes())
+	// CPU c is in node c*nodes/cores, so node n contains the CPUs in
+	// [ceil(n*cores/nodes), ceil((n+1)*cores/nodes)).
+	start = (uint(node)*cores + nodes - 1) / nodes
+	end = (uint(node+1)*cores + nodes - 1) / nodes
+	return start, end
+}
+
+// SetApplicationCores changes the number of CPUs visible to sandboxed
+// applications to n. The allowed CPU masks of existing tasks are adjusted to
+// the new number of CPUs: CPUs above n are removed, tasks that were allowed to
+// run on all CPUs remain so, and tasks left with no allowed CPUs are allowed
+// to run on all CPUs.
+func (k *Kernel) SetApplicationCores(n uint) error {
+	if n == 0 {
+		return fmt.Errorf("the number of CPUs must be positive")
+	}
+	if k.useHostCores {
+		return fmt.Errorf("UseHostCores enabled: can't change ApplicationCores")
+	}
+	if k.hostCPUs != nil {
+		return fmt.Errorf("HostCPUs set: can't change ApplicationCores")
+	}
+
+	// Stop all tasks so that none of them observes a CPU mask that is
+	// inconsistent with the number of CPUs.
+	k.Pause()
+	defer k.Unpause()
+
+	old := k.ApplicationCores()
+	k.applicationCores.Store(uint32(n))
+
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	for t, tid := range k.tasks.Root.tids {
+		t.mu.Lock()
+		t.allowedCPUMask = resizeCPUMask(t.allowedCPUMask, old, n)
+		t.cpu.Store(assignCPU(t.allowedCPUMask, tid))
+		t.mu.Unlock()
+	}
+	if r, ok := k.Platform.(platform.CPUResizer); ok {
+		r.SetNumCPUs(int(n))
+	}
+	log.Infof("Changed ApplicationCores from %d to %d", old, n)
+	return nil
 }
 
 // RealtimeClock returns the application CLOCK_REALTIME clock.
@@ -1667,6 +1846,26 @@ const (
 	unimplementedSyscallBurst    = 1000 // events
 )
 
+// UnimplementedSyscallObserver is notified of syscalls that fail because the
+// sentry doesn't support them, as opposed to syscalls that fail because of the
+// application's request.
+type UnimplementedSyscallObserver interface {
+	// ObserveUnimplementedSyscall is called on t's task goroutine with t's
+	// registers each time t invokes an unimplemented syscall. Unlike
+	// UnimplementedSyscall events, calls are not rate limited. regs must not
+	// be retained or modified.
+	//
+	// If ObserveUnimplementedSyscall returns true, t's thread group is killed
+	// by SIGSYS when the syscall returns.
+	ObserveUnimplementedSyscall(t *Task, regs *rpb.Registers) bool
+}
+
+// SetUnimplementedSyscallObserver sets the UnimplementedSyscallObserver. It
+// must be called before any tasks are started.
+func (k *Kernel) SetUnimplementedSyscallObserver(o UnimplementedSyscallObserver) {
+	k.unimplementedSyscallObserver = o
+}
+
 // EmitUnimplementedEvent emits an UnimplementedSyscall event via the event
 // channel.
 func (k *Kernel) EmitUnimplementedEvent(ctx context.Context) {
@@ -1675,9 +1874,14 @@ func (k *Kernel) EmitUnimplementedEvent(ctx context.Context) {
 	})
 
 	t := TaskFromContext(ctx)
+	regs := t.Arch().StateData().Proto()
+	if o := k.unimplementedSyscallObserver; o != nil && o.ObserveUnimplementedSyscall(t, regs) {
+		// See Task.executeSyscall.
+		t.unimplementedSyscallKill = true
+	}
 	_, _ = k.unimplementedSyscallEmitter.Emit(&uspb.UnimplementedSyscall{
 		Tid:       int32(t.ThreadID()),
-		Registers: t.Arch().StateData().Proto(),
+		Registers: regs,
 	})
 }
 
@@ -1826,7 +2030,7 @@ func (k *Kernel) GetUserCounters(uid auth.KUID) *userCounters {
 		return uc
 	}
 
-	uc := &userCounters{}
+	uc := &userCounters{uid: uid}
 	k.userCountersMap[uid] = uc
 	return uc
 }
@@ -0,0 +1,167 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+)
+
+// limitGroupPeriod is the number of CPU clock ticks over which a LimitGroup's
+// CPU quota is enforced. This is the same as the default CFS bandwidth period
+// of 100ms.
+const limitGroupPeriod = 10
+
+// LimitGroup constrains the combined CPU and memory usage of a tree of thread
+// groups, independently of the limits of the container they run in. Thread
+// groups created by a member of a LimitGroup join the same LimitGroup.
+//
+// +stateify savable
+type LimitGroup struct {
+	// cpus is the number of CPUs worth of CPU time that members may consume
+	// in each period. If cpus is 0, CPU usage is unlimited.
+	//
+	// cpus is immutable.
+	cpus float64
+
+	// memoryLimit is the maximum combined resident set size of members in
+	// bytes. When it is exceeded, all members are killed. If memoryLimit is
+	// 0, memory usage is unlimited.
+	//
+	// memoryLimit is immutable.
+	memoryLimit uint64
+
+	// periodStart is the CPU clock tick at which the current period began.
+	//
+	// periodStart is protected by Kernel.cpuClockMu.
+	periodStart uint64
+
+	// usedTicks is the number of CPU clock ticks consumed by members in the
+	// current period.
+	//
+	// usedTicks is protected by Kernel.cpuClockMu.
+	usedTicks uint64
+
+	// throttledUntil is the application monotonic time, in nanoseconds, until
+	// which members may not return to application code.
+	throttledUntil atomicbitops.Int64
+}
+
+// NewLimitGroup returns a new LimitGroup. A value of 0 for cpus or
+// memoryLimit leaves that resource unlimited.
+func NewLimitGroup(cpus float64, memoryLimit uint64) *LimitGroup {
+	return &LimitGroup{
+		cpus:        cpus,
+		memoryLimit: memoryLimit,
+	}
+}
+
+// LimitGroup returns the LimitGroup that tg belongs to, or nil if tg doesn't
+// belong to one.
+func (tg *ThreadGroup) LimitGroup() *LimitGroup {
+	return tg.limitGroup
+}
+
+// chargeLocked charges lg for the tasks in tg that are running during CPU
+// clock tick now. It returns true if a new period began, in which case the
+// caller should call enforceMemoryLimit once CPU clock locks are released.
+//
+// Preconditions:
+//   - k.cpuClockMu is locked.
+//   - The TaskSet mutex is locked for reading.
+//   - tg.limitGroup == lg.
+func (lg *LimitGroup) chargeLocked(k *Kernel, tg *ThreadGroup, now uint64) bool {
+	newPeriod := now-lg.periodStart >= limitGroupPeriod
+	if newPeriod {
+		lg.periodStart = now
+		lg.usedTicks = 0
+		lg.throttledUntil.Store(0)
+	}
+	if lg.cpus == 0 {
+		return newPeriod
+	}
+	for t := tg.tasks.Front(); t != nil; t = t.Next() {
+		switch t.TaskGoroutineSchedInfo().State {
+		case TaskGoroutineRunningApp, TaskGoroutineRunningSys:
+			lg.usedTicks++
+		}
+	}
+	if float64(lg.usedTicks) > lg.cpus*limitGroupPeriod && lg.throttledUntil.Load() == 0 {
+		remaining := time.Duration(lg.periodStart+limitGroupPeriod-now) * linux.ClockTick
+		lg.throttledUntil.Store(k.MonotonicClock().Now().Add(remaining).Nanoseconds())
+	}
+	return newPeriod
+}
+
+// throttleDelay returns the duration for which members of lg must stay out of
+// application code because lg has exhausted its CPU quota.
+func (lg *LimitGroup) throttleDelay(k *Kernel) time.Duration {
+	until := lg.throttledUntil.Load()
+	if until == 0 {
+		return 0
+	}
+	return time.Duration(until - k.MonotonicClock().Now().Nanoseconds())
+}
+
+// enforceMemoryLimit kills all members of lg if their combined resident set
+// size exceeds lg's memory limit, similar to a memory cgroup OOM kill.
+func (lg *LimitGroup) enforceMemoryLimit(k *Kernel) {
+	if lg.memoryLimit == 0 {
+		return
+	}
+	var members []*ThreadGroup
+	var leaders []*Task
+	tgs := k.tasks.Root.ThreadGroups()
+	k.tasks.mu.RLock()
+	for _, tg := range tgs {
+		if tg.limitGroup == lg && tg.leader != nil {
+			members = append(members, tg)
+			leaders = append(leaders, tg.leader)
+		}
+	}
+	k.tasks.mu.RUnlock()
+
+	// Thread groups may share a MemoryManager, which must only be counted
+	// once.
+	mms := make(map[*mm.MemoryManager]struct{})
+	var rss uint64
+	for _, leader := range leaders {
+		var m *mm.MemoryManager
+		leader.WithMuLocked(func(t *Task) {
+			m = t.MemoryManager()
+		})
+		if m == nil {
+			continue
+		}
+		if _, ok := mms[m]; ok {
+			continue
+		}
+		mms[m] = struct{}{}
+		rss += m.ResidentSetSize()
+	}
+	if rss <= lg.memoryLimit {
+		return
+	}
+
+	log.Warningf("Limit group exceeded its memory limit (%d > %d bytes), killing %d processes", rss, lg.memoryLimit, len(members))
+	for _, tg := range members {
+		// Members may have exited concurrently, so errors are expected.
+		_ = tg.SendSignal(SignalInfoPriv(linux.SIGKILL))
+	}
+}
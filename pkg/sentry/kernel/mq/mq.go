@@ -43,9 +43,10 @@ const (
 // MaxName is the maximum size for a queue name.
 const MaxName = 255
 
-const (
-	maxPriority = linux.MQ_PRIO_MAX - 1 // Highest possible message priority.
+// MaxPriority is the highest possible message priority.
+const MaxPriority = linux.MQ_PRIO_MAX - 1
 
+const (
 	maxQueuesDefault = linux.DFLT_QUEUESMAX // Default max number of queues.
 
 	maxMsgDefault   = linux.DFLT_MSG    // Default max number of messages per queue.
@@ -85,13 +86,13 @@ type RegistryImpl interface {
 	// Get searchs for a queue with the given name, if it exists, the queue is
 	// used to create a new FD, return it and return true. If the queue  doesn't
 	// exist, return false and no error. An error is returned if creation fails.
-	Get(ctx context.Context, name string, access AccessType, block bool, flags uint32) (*vfs.FileDescription, bool, error)
+	Get(ctx context.Context, name string, access AccessType, flags uint32) (*vfs.FileDescription, bool, error)
 
 	// New creates a new inode and file description using the given queue,
 	// inserts the inode into the filesystem tree using the given name, and
 	// returns the file description. An error is returned if creation fails, or
 	// if the name already exists.
-	New(ctx context.Context, name string, q *Queue, access AccessType, block bool, perm linux.FileMode, flags uint32) (*vfs.FileDescription, error)
+	New(ctx context.Context, name string, q *Queue, access AccessType, perm linux.FileMode, flags uint32) (*vfs.FileDescription, error)
 
 	// Unlink removes the queue with given name from the registry, and returns
 	// an error if the name doesn't exist.
@@ -146,9 +147,10 @@ func (r *Registry) FindOrCreate(ctx context.Context, opts OpenOpts, mode linux.F
 		return nil, linuxerr.EINVAL
 	}
 
-	// Construct status flags.
+	// Construct status flags. Whether Send and Receive block is determined by
+	// O_NONBLOCK, which may be changed later by mq_getsetattr(2).
 	var flags uint32
-	if opts.Block {
+	if !opts.Block {
 		flags = linux.O_NONBLOCK
 	}
 	switch opts.Access {
@@ -162,7 +164,7 @@ func (r *Registry) FindOrCreate(ctx context.Context, opts OpenOpts, mode linux.F
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	fd, ok, err := r.impl.Get(ctx, opts.Name, opts.Access, opts.Block, flags)
+	fd, ok, err := r.impl.Get(ctx, opts.Name, opts.Access, flags)
 	if err != nil {
 		return nil, err
 	}
@@ -186,7 +188,7 @@ func (r *Registry) FindOrCreate(ctx context.Context, opts OpenOpts, mode linux.F
 	if err != nil {
 		return nil, err
 	}
-	return r.impl.New(ctx, opts.Name, q, opts.Access, opts.Block, mode.Permissions(), flags)
+	return r.impl.New(ctx, opts.Name, q, opts.Access, mode.Permissions(), flags)
 }
 
 // newQueueLocked creates a new queue using the given attributes. If attr is nil
@@ -285,14 +287,39 @@ type Queue struct {
 
 	// byteCount is the number of bytes of data in all messages in the queue.
 	byteCount uint64
+
+	// receivers is the number of tasks blocked in Receive.
+	receivers int
+}
+
+// Blocker is used to block in Queue.Send and Queue.Receive. It serves as an
+// abstraction of kernel.Task, which can't be used directly to avoid a circular
+// dependency.
+type Blocker interface {
+	// BlockWithTimer blocks until an event is received from C or tchan, or
+	// the blocker is interrupted. It returns nil if an event is received from
+	// C, ETIMEDOUT if an event is received from tchan, and
+	// linuxerr.ErrInterrupted if interrupted. A nil tchan never fires.
+	BlockWithTimer(C <-chan struct{}, tchan <-chan struct{}) error
 }
 
 // View is a view into a message queue. Views should only be used in file
 // descriptions, but not inodes, because we use inodes to retreive the actual
 // queue, and only FDs are responsible for providing user functionality.
 type View interface {
-	// TODO: Add Send and Receive when mq_timedsend(2) and mq_timedreceive(2)
-	// are implemented.
+	// Send adds a message to the queue. See mq_timedsend(2).
+	Send(ctx context.Context, b Blocker, msg Message, block bool, tchan <-chan struct{}) error
+
+	// Receive removes the oldest message with the highest priority from the
+	// queue and returns it. See mq_timedreceive(2).
+	Receive(ctx context.Context, b Blocker, bufSize uint64, block bool, tchan <-chan struct{}) (*Message, error)
+
+	// Subscribe registers or removes a notification request. See
+	// mq_notify(3).
+	Subscribe(ctx context.Context, s *Subscriber) error
+
+	// Attr returns the attributes of the queue. See mq_getsetattr(2).
+	Attr() linux.MqAttr
 
 	// Flush checks if the calling process has attached a notification request
 	// to this queue, if yes, then the request is removed, and another process
@@ -305,33 +332,37 @@ type View interface {
 // ReaderWriter provides a send and receive view into a queue.
 type ReaderWriter struct {
 	*Queue
-
-	block bool
 }
 
-// Reader provides a send-only view into a queue.
+// Reader provides a receive-only view into a queue.
 type Reader struct {
 	*Queue
+}
 
-	block bool
+// Send implements View.Send.
+func (Reader) Send(context.Context, Blocker, Message, bool, <-chan struct{}) error {
+	return linuxerr.EBADF
 }
 
-// Writer provides a receive-only view into a queue.
+// Writer provides a send-only view into a queue.
 type Writer struct {
 	*Queue
+}
 
-	block bool
+// Receive implements View.Receive.
+func (Writer) Receive(context.Context, Blocker, uint64, bool, <-chan struct{}) (*Message, error) {
+	return nil, linuxerr.EBADF
 }
 
 // NewView creates a new view into a queue and returns it.
-func NewView(q *Queue, access AccessType, block bool) (View, error) {
+func NewView(q *Queue, access AccessType) (View, error) {
 	switch access {
 	case ReadWrite:
-		return ReaderWriter{Queue: q, block: block}, nil
+		return ReaderWriter{Queue: q}, nil
 	case WriteOnly:
-		return Writer{Queue: q, block: block}, nil
+		return Writer{Queue: q}, nil
 	case ReadOnly:
-		return Reader{Queue: q, block: block}, nil
+		return Reader{Queue: q}, nil
 	default:
 		// This case can't happen, due to O_RDONLY flag being 0 and O_WRONLY
 		// being 1, so one of them must be true.
@@ -356,14 +387,195 @@ type Message struct {
 	Priority uint32
 }
 
+// Notifier delivers the notification requested by a Subscriber. It is
+// implemented outside of this package, which can't depend on kernel.Task or
+// kernel.ThreadGroup.
+type Notifier interface {
+	// Notify is called when a message is sent to an empty queue, with the
+	// context of the sending task.
+	Notify(ctx context.Context)
+}
+
 // Subscriber represents a task registered for async notification from a Queue.
 //
 // +stateify savable
 type Subscriber struct {
-	// TODO: Add fields when mq_notify(2) is implemented.
-
 	// pid is the PID of the registered task.
 	pid int32
+
+	// method is the notification method, one of linux.SIGEV_SIGNAL and
+	// linux.SIGEV_NONE.
+	method int32
+
+	// signo is the signal sent if method is linux.SIGEV_SIGNAL.
+	signo int32
+
+	// notifier delivers the notification. It is nil if method is
+	// linux.SIGEV_NONE.
+	notifier Notifier
+}
+
+// NewSubscriber returns a Subscriber for the calling process, which requests
+// notification using the given method and signal number, delivered by
+// notifier. See mq_notify(3).
+func NewSubscriber(ctx context.Context, method, signo int32, notifier Notifier) *Subscriber {
+	pid, _ := auth.ThreadGroupIDFromContext(ctx)
+	return &Subscriber{
+		pid:      pid,
+		method:   method,
+		signo:    signo,
+		notifier: notifier,
+	}
+}
+
+// Send implements View.Send.
+func (q *Queue) Send(ctx context.Context, b Blocker, msg Message, block bool, tchan <-chan struct{}) error {
+	if msg.Size > q.maxMessageSize {
+		return linuxerr.EMSGSIZE
+	}
+
+	var (
+		e  waiter.Entry
+		ch chan struct{}
+	)
+	for {
+		q.mu.Lock()
+		if q.messageCount < q.maxMessageCount {
+			break
+		}
+		if !block {
+			q.mu.Unlock()
+			return linuxerr.EAGAIN
+		}
+		if ch == nil {
+			e, ch = waiter.NewChannelEntry(waiter.WritableEvents)
+			q.queue.EventRegister(&e)
+			defer q.EventUnregister(&e)
+		}
+		q.mu.Unlock()
+		if err := b.BlockWithTimer(ch, tchan); err != nil {
+			return err
+		}
+	}
+
+	// Messages are ordered by decreasing priority, and messages with the
+	// same priority are ordered by send time.
+	m := &Message{
+		Text:     msg.Text,
+		Size:     msg.Size,
+		Priority: msg.Priority,
+	}
+	cur := q.messages.Back()
+	for cur != nil && cur.Priority < m.Priority {
+		cur = cur.Prev()
+	}
+	if cur == nil {
+		q.messages.PushFront(m)
+	} else {
+		q.messages.InsertAfter(cur, m)
+	}
+	q.messageCount++
+	q.byteCount += m.Size
+
+	// "Message notification occurs only when a new message arrives and the
+	//  queue was previously empty. ... If some other process or thread is
+	//  waiting to receive a message from an empty queue using mq_receive(3),
+	//  then any message notification registration is ignored: the message
+	//  is delivered to the process or thread calling mq_receive(3), and the
+	//  message notification registration remains in effect." - mq_notify(3)
+	var notifier Notifier
+	if q.subscriber != nil && q.messageCount == 1 && q.receivers == 0 {
+		// "After notification occurs, the notification registration is
+		//  removed and the message queue is available for further
+		//  registration."
+		notifier = q.subscriber.notifier
+		q.subscriber = nil
+	}
+	q.mu.Unlock()
+
+	q.queue.Notify(waiter.ReadableEvents)
+	if notifier != nil {
+		notifier.Notify(ctx)
+	}
+	return nil
+}
+
+// Receive implements View.Receive.
+func (q *Queue) Receive(ctx context.Context, b Blocker, bufSize uint64, block bool, tchan <-chan struct{}) (*Message, error) {
+	q.mu.Lock()
+	if bufSize < q.maxMessageSize {
+		q.mu.Unlock()
+		return nil, linuxerr.EMSGSIZE
+	}
+
+	var (
+		e  waiter.Entry
+		ch chan struct{}
+	)
+	for q.messageCount == 0 {
+		if !block {
+			q.mu.Unlock()
+			return nil, linuxerr.EAGAIN
+		}
+		if ch == nil {
+			e, ch = waiter.NewChannelEntry(waiter.ReadableEvents)
+			q.queue.EventRegister(&e)
+			defer q.EventUnregister(&e)
+		}
+		q.receivers++
+		q.mu.Unlock()
+		err := b.BlockWithTimer(ch, tchan)
+		q.mu.Lock()
+		q.receivers--
+		if err != nil {
+			q.mu.Unlock()
+			return nil, err
+		}
+	}
+
+	m := q.messages.Front()
+	q.messages.Remove(m)
+	q.messageCount--
+	q.byteCount -= m.Size
+	q.mu.Unlock()
+
+	q.queue.Notify(waiter.WritableEvents)
+	return m, nil
+}
+
+// Subscribe implements View.Subscribe. It registers s for notification from q,
+// or removes the calling
+// process's registration if s is nil. See mq_notify(3).
+func (q *Queue) Subscribe(ctx context.Context, s *Subscriber) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pid, _ := auth.ThreadGroupIDFromContext(ctx)
+	if s == nil {
+		if q.subscriber != nil && q.subscriber.pid == pid {
+			q.subscriber = nil
+		}
+		return nil
+	}
+	if q.subscriber != nil {
+		// "Another process has already registered to receive notification
+		//  for this message queue."
+		return linuxerr.EBUSY
+	}
+	q.subscriber = s
+	return nil
+}
+
+// Attr implements View.Attr. MqFlags is not set, since it is a property of the
+// open file description.
+func (q *Queue) Attr() linux.MqAttr {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return linux.MqAttr{
+		MqMaxmsg:  q.maxMessageCount,
+		MqMsgsize: int64(q.maxMessageSize),
+		MqCurmsgs: q.messageCount,
+	}
 }
 
 // Generate implements vfs.DynamicBytesSource.Generate. Queue is used as a
@@ -379,7 +591,8 @@ func (q *Queue) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	)
 	if q.subscriber != nil {
 		pid = q.subscriber.pid
-		// TODO: add method and sigNumber when mq_notify(2) is implemented.
+		method = int(q.subscriber.method)
+		sigNumber = int(q.subscriber.signo)
 	}
 
 	buf.WriteString(
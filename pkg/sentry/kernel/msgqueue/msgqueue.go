@@ -216,6 +216,28 @@ func (r *Registry) FindByID(id ipc.ID) (*Queue, error) {
 	return mech.(*Queue), nil
 }
 
+// Queues returns all queues in the registry, sorted by ID.
+func (r *Registry) Queues() []*Queue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	objs := r.reg.Objects()
+	queues := make([]*Queue, 0, len(objs))
+	for _, o := range objs {
+		queues = append(queues, o.(*Queue))
+	}
+	return queues
+}
+
+// HighestIndex returns the index of the highest used entry in the kernel's
+// array of queues, as returned by msgctl(IPC_INFO) and msgctl(MSG_INFO).
+// Queues are not tracked in an array, so IDs are used as indices.
+func (r *Registry) HighestIndex() int32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int32(r.reg.HighestID())
+}
+
 // IPCInfo reports global parameters for message queues. See msgctl(IPC_INFO).
 func (r *Registry) IPCInfo(ctx context.Context) *linux.MsgInfo {
 	return &linux.MsgInfo{
@@ -0,0 +1,269 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// oomKills is a metric that tracks how many thread groups the OOM killer has
+// killed.
+var oomKills = metric.MustCreateNewUint64Metric("/memory/oom_kills", false /* sync */, "Number of processes killed by the OOM killer.")
+
+// oomScoreAdjMin is the oom_score_adj that exempts a thread group from the OOM
+// killer, from Linux's include/uapi/linux/oom.h:OOM_SCORE_ADJ_MIN.
+const oomScoreAdjMin = -1000
+
+// oomRetryDelay is the delay before a task whose page fault failed due to the
+// memory limit retries the fault, giving the OOM killer time to free memory.
+const oomRetryDelay = 10 * time.Millisecond
+
+// oomSwapBatch is the minimum number of bytes that the OOM killer tries to
+// swap out before killing anything, if swap is enabled, so that subsequent
+// allocations don't immediately reach the limit again.
+const oomSwapBatch = 8 << 20
+
+// oomState is the state of the OOM killer.
+//
+// +stateify savable
+type oomState struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// enabled is true if EnableOOMKiller has been called. enabled is
+	// protected by mu.
+	enabled bool
+
+	// victim is the last thread group killed by the OOM killer. As in
+	// Linux, no new victim is selected while victim is still exiting.
+	// victim is protected by mu.
+	victim *ThreadGroup
+
+	// kills maps container IDs to the number of thread groups the OOM killer
+	// has killed in each container. kills is protected by mu.
+	kills map[string]uint64
+}
+
+// EnableOOMKiller limits the memory that may be allocated from k's
+// MemoryFile to limit bytes. When an allocation would exceed the limit, a
+// thread group is selected by its memory usage and oom_score_adj and killed
+// with SIGKILL, as by Linux's OOM killer.
+//
+// If EnableOOMKiller is not called, allocations are only limited by the
+// host, which typically kills the whole sandbox.
+func (k *Kernel) EnableOOMKiller(limit uint64) {
+	k.oom.mu.Lock()
+	k.oom.enabled = true
+	k.oom.mu.Unlock()
+	k.mf.SetLimit(limit, k.outOfMemory)
+	log.Infof("OOM killer enabled with a limit of %d bytes", limit)
+}
+
+// OOMKillerEnabled returns true if EnableOOMKiller has been called.
+func (k *Kernel) OOMKillerEnabled() bool {
+	k.oom.mu.Lock()
+	defer k.oom.mu.Unlock()
+	return k.oom.enabled
+}
+
+// OOMKills returns the number of thread groups that the OOM killer has killed
+// in the container with the given ID.
+func (k *Kernel) OOMKills(cid string) uint64 {
+	k.oom.mu.Lock()
+	defer k.oom.mu.Unlock()
+	return k.oom.kills[cid]
+}
+
+// oomCandidate is a thread group that may be killed by the OOM killer.
+type oomCandidate struct {
+	tg      *ThreadGroup
+	mm      *mm.MemoryManager
+	tgid    ThreadID
+	name    string
+	cid     string
+	adj     int32
+	totalVM uint64
+	rss     uint64
+	anonRSS uint64
+	fileRSS uint64
+	points  int64
+}
+
+// outOfMemory is called by k's MemoryFile when an allocation of length bytes
+// fails due to the limit set by EnableOOMKiller.
+func (k *Kernel) outOfMemory(length uint64) {
+	// Give evictable memory a chance to be freed before killing anything.
+	k.mf.StartEvictions()
+	k.mf.WaitForEvictions()
+	if limit, allocated := k.mf.Limit(); allocated+length <= limit {
+		return
+	}
+
+	// Then swap out memory that hasn't been used recently.
+	if k.mf.SwapEnabled() {
+		limit, allocated := k.mf.Limit()
+		want := uint64(oomSwapBatch)
+		if allocated+length > limit && allocated+length-limit > want {
+			want = allocated + length - limit
+		}
+		swapped := k.mf.Swap(k.SupervisorContext(), want)
+		if limit, allocated := k.mf.Limit(); allocated+length <= limit {
+			log.Debugf("Swapped out %d bytes to satisfy allocation of %d bytes", swapped, length)
+			return
+		}
+	}
+
+	k.oom.mu.Lock()
+	defer k.oom.mu.Unlock()
+
+	ts := k.tasks
+	ts.mu.RLock()
+	if tg := k.oom.victim; tg != nil && tg.hasLiveTasksLocked() {
+		// The previous victim's memory will be freed when it exits.
+		ts.mu.RUnlock()
+		return
+	}
+	k.oom.victim = nil
+	var candidates []*oomCandidate
+	ts.forEachThreadGroupLocked(func(tg *ThreadGroup) {
+		if c := k.oomCandidateLocked(tg); c != nil {
+			candidates = append(candidates, c)
+		}
+	})
+	ts.mu.RUnlock()
+	ctx := k.SupervisorContext()
+	for _, c := range candidates {
+		c.fill(ctx)
+	}
+
+	// Score candidates as in Linux's mm/oom_kill.c:oom_badness(), in units of
+	// pages.
+	limit, allocated := k.mf.Limit()
+	totalPages := int64(limit / hostarch.PageSize)
+	var victim *oomCandidate
+	for _, c := range candidates {
+		if c.adj == oomScoreAdjMin {
+			continue
+		}
+		c.points = int64(c.rss/hostarch.PageSize) + int64(c.adj)*totalPages/1000
+		if victim == nil || c.points > victim.points {
+			victim = c
+		}
+	}
+	log.Warningf("Out of memory: failed to allocate %d bytes with %d bytes allocated", length, allocated)
+	log.Warningf("%s", oomReport(candidates))
+	if victim == nil {
+		panic("Out of memory and no killable processes")
+	}
+
+	if err := victim.tg.SendSignal(SignalInfoPriv(linux.SIGKILL)); err != nil {
+		log.Warningf("Failed to kill OOM victim %d (%s): %v", victim.tgid, victim.name, err)
+		return
+	}
+	k.oom.victim = victim.tg
+	if k.oom.kills == nil {
+		k.oom.kills = make(map[string]uint64)
+	}
+	k.oom.kills[victim.cid]++
+	oomKills.Increment()
+	log.Warningf("Out of memory: Killed process %d (%s) container %q total-vm:%dkB, anon-rss:%dkB, file-rss:%dkB, oom_score_adj:%d",
+		victim.tgid, victim.name, victim.cid, victim.totalVM/1024, victim.anonRSS/1024, victim.fileRSS/1024, victim.adj)
+}
+
+// oomCandidateLocked returns an oomCandidate for tg, or nil if tg may not be
+// killed by the OOM killer. If oomCandidateLocked returns a non-nil
+// oomCandidate, the caller must call oomCandidate.fill.
+//
+// Preconditions: k.tasks.mu must be locked.
+func (k *Kernel) oomCandidateLocked(tg *ThreadGroup) *oomCandidate {
+	leader := tg.leader
+	if leader == nil || tg == k.globalInit || !tg.hasLiveTasksLocked() {
+		return nil
+	}
+	var tmm *mm.MemoryManager
+	for t := tg.tasks.Front(); t != nil && tmm == nil; t = t.Next() {
+		t.WithMuLocked(func(t *Task) {
+			if m := t.image.MemoryManager; m != nil && m.IncUsers() {
+				tmm = m
+			}
+		})
+	}
+	if tmm == nil {
+		// Kernel threads and exiting tasks hold no application memory.
+		return nil
+	}
+	return &oomCandidate{
+		tg:   tg,
+		mm:   tmm,
+		tgid: k.tasks.Root.tgids[tg],
+		name: leader.Name(),
+		cid:  leader.ContainerID(),
+		adj:  tg.oomScoreAdj.Load(),
+	}
+}
+
+// fill fills in c's memory usage and releases c.mm.
+func (c *oomCandidate) fill(ctx context.Context) {
+	c.totalVM = c.mm.VirtualMemorySize()
+	c.rss = c.mm.ResidentSetSize()
+	c.anonRSS, c.fileRSS = c.mm.ResidentSetSizeBreakdown()
+	c.mm.DecUsers(ctx)
+	c.mm = nil
+}
+
+// hasLiveTasksLocked returns true if any task in tg has not yet exited.
+//
+// Preconditions: The TaskSet mutex must be locked.
+func (tg *ThreadGroup) hasLiveTasksLocked() bool {
+	for t := tg.tasks.Front(); t != nil; t = t.Next() {
+		if t.exitState < TaskExitZombie {
+			return true
+		}
+	}
+	return false
+}
+
+// oomReport returns a table of OOM killer candidates, similar to the task
+// dump logged by Linux's mm/oom_kill.c:dump_tasks().
+func oomReport(candidates []*oomCandidate) string {
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].tgid < candidates[j].tgid })
+	var b strings.Builder
+	fmt.Fprintf(&b, "Tasks state (memory values in pages):\n")
+	fmt.Fprintf(&b, "[  pid  ]   total_vm      rss  anon_rss  file_rss oom_score_adj container name\n")
+	for _, c := range candidates {
+		fmt.Fprintf(&b, "[%7d] %10d %8d %9d %9d %13d %s %s\n",
+			c.tgid, c.totalVM/hostarch.PageSize, c.rss/hostarch.PageSize, c.anonRSS/hostarch.PageSize,
+			c.fileRSS/hostarch.PageSize, c.adj, c.cid, c.name)
+	}
+	return b.String()
+}
+
+// waitForOOM is called by a task whose page fault failed because the memory
+// limit set by EnableOOMKiller was reached. It blocks t briefly, allowing the
+// OOM killer to free memory before the fault is retried. If t is itself
+// killed, the pending SIGKILL interrupts the wait.
+func (t *Task) waitForOOM() {
+	t.BlockWithTimeout(nil, true, oomRetryDelay)
+}
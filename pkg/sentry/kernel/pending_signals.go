@@ -127,6 +127,32 @@ func (p *pendingSignals) dequeueSpecific(sig linux.Signal) *linux.SignalInfo {
 	return ps.SignalInfo
 }
 
+// peek returns copies of at most n pending signals, skipping the first off.
+// Signals are ordered by signal number and then by the order in which they
+// were enqueued, which is the order in which dequeue returns them if none are
+// masked.
+func (p *pendingSignals) peek(off uint64, n int) []linux.SignalInfo {
+	var infos []linux.SignalInfo
+	for i := range p.signals {
+		q := &p.signals[i]
+		if off >= uint64(q.length) {
+			off -= uint64(q.length)
+			continue
+		}
+		for ps := q.pendingSignalList.Front(); ps != nil; ps = ps.Next() {
+			if off > 0 {
+				off--
+				continue
+			}
+			if len(infos) == n {
+				return infos
+			}
+			infos = append(infos, *ps.SignalInfo)
+		}
+	}
+	return infos
+}
+
 // discardSpecific causes all pending signals with number sig to be discarded.
 func (p *pendingSignals) discardSpecific(sig linux.Signal) {
 	q := &p.signals[sig.Index()]
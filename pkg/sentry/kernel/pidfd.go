@@ -0,0 +1,106 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// PIDFD implements vfs.FileDescriptionImpl for pidfds, as returned by
+// pidfd_open(2) and clone(CLONE_PIDFD).
+//
+// A pidfd refers to a thread group rather than to a thread ID, so it keeps
+// referring to the same process after the process has been reaped, even if
+// its thread ID is reused.
+//
+// +stateify savable
+type PIDFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	// tg is the thread group that the pidfd refers to. tg is immutable.
+	tg *ThreadGroup
+}
+
+var _ vfs.FileDescriptionImpl = (*PIDFD)(nil)
+
+// NewPIDFD returns a new pidfd referring to tg. flags may contain
+// linux.PIDFD_NONBLOCK.
+func NewPIDFD(ctx context.Context, vfsObj *vfs.VirtualFilesystem, tg *ThreadGroup, flags uint32) (*vfs.FileDescription, error) {
+	vd := vfsObj.NewAnonVirtualDentry("[pidfd]")
+	defer vd.DecRef(ctx)
+	fd := &PIDFD{tg: tg}
+	if err := fd.vfsfd.Init(fd, linux.O_RDWR|flags, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+		DenyPRead:         true,
+		DenyPWrite:        true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// ThreadGroup returns the thread group that fd refers to.
+func (fd *PIDFD) ThreadGroup() *ThreadGroup {
+	return fd.tg
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *PIDFD) Release(context.Context) {}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (fd *PIDFD) Readiness(mask waiter.EventMask) waiter.EventMask {
+	ts := fd.tg.pidns.owner
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return mask & fd.tg.pidfdReadinessLocked()
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (fd *PIDFD) EventRegister(e *waiter.Entry) error {
+	fd.tg.pidfdQueue.EventRegister(e)
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (fd *PIDFD) EventUnregister(e *waiter.Entry) {
+	fd.tg.pidfdQueue.EventUnregister(e)
+}
+
+// Epollable implements FileDescriptionImpl.Epollable.
+func (fd *PIDFD) Epollable() bool {
+	return true
+}
+
+// pidfdReadinessLocked returns the events of pidfds referring to tg. As in
+// Linux, pidfds become readable once all tasks in tg have exited, and are hung
+// up once tg has been reaped.
+//
+// Preconditions: The TaskSet mutex must be locked.
+func (tg *ThreadGroup) pidfdReadinessLocked() waiter.EventMask {
+	var ready waiter.EventMask
+	if tg.liveTasks == 0 {
+		ready |= waiter.ReadableEvents
+	}
+	if tg.tasksCount == 0 {
+		ready |= waiter.EventHUp
+	}
+	return ready
+}
@@ -0,0 +1,401 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// PressureResource is a resource for which pressure stall information (PSI)
+// is tracked, as in Linux's include/linux/psi_types.h.
+type PressureResource int
+
+// Pressure resources.
+const (
+	PressureIO PressureResource = iota
+	PressureMemory
+	PressureCPU
+
+	numPressureResources
+)
+
+// String implements fmt.Stringer.String.
+func (r PressureResource) String() string {
+	switch r {
+	case PressureIO:
+		return "io"
+	case PressureMemory:
+		return "memory"
+	case PressureCPU:
+		return "cpu"
+	default:
+		return fmt.Sprintf("PressureResource(%d)", int(r))
+	}
+}
+
+const (
+	// pressureSome and pressureFull index per-resource state. "some" is the
+	// time during which at least one task is stalled on the resource; "full"
+	// is the time during which all non-idle tasks are stalled on it.
+	pressureSome = iota
+	pressureFull
+	numPressureStates
+)
+
+// pressureAvgPeriod is the interval at which pressure averages are sampled,
+// from Linux's kernel/sched/psi.c:PSI_FREQ.
+const pressureAvgPeriod = 2 * time.Second
+
+// pressureAvgWindows are the windows of the exponential moving averages
+// reported as avg10, avg60 and avg300.
+var pressureAvgWindows = [...]time.Duration{10 * time.Second, 60 * time.Second, 300 * time.Second}
+
+// Constraints on trigger windows, from Linux's kernel/sched/psi.c.
+const (
+	pressureWindowMin = 500 * time.Millisecond
+	pressureWindowMax = 10 * time.Second
+)
+
+// pressureState tracks stall time for all pressure resources.
+//
+// The sentry has no page reclaim and no run queue, so stalls are derived from
+// what it does observe:
+//
+//   - A task is stalled on memory while the sentry handles one of its page
+//     faults, which may need to allocate memory or refill pages from a file.
+//
+//   - A task is stalled on CPU while it is throttled by its LimitGroup, and
+//     tasks are additionally considered to be waiting for CPU while more tasks
+//     are running than there are application cores.
+//
+//   - I/O stalls on the host are not observable and are always reported as
+//     zero.
+//
+// Stall counts change without synchronization; time is attributed to the
+// states they imply whenever update is called, which happens when a resource
+// starts or stops being stalled and on each CPU clock tick.
+//
+// +stateify savable
+type pressureState struct {
+	// memStalled is the number of tasks stalled on memory.
+	memStalled atomicbitops.Int64
+
+	// cpuThrottled is the number of tasks stalled on CPU by throttling.
+	cpuThrottled atomicbitops.Int64
+
+	// mu protects the following fields.
+	mu sync.Mutex `state:"nosave"`
+
+	// lastUpdate is the time in nanoseconds of the last call to update.
+	lastUpdate int64
+
+	// stalled holds the stall states that were observed by the last call
+	// to update.
+	stalled [numPressureResources][numPressureStates]bool
+
+	// total is the cumulative stall time.
+	total [numPressureResources][numPressureStates]time.Duration
+
+	// avgs are the moving averages of the stall time, as percentages.
+	avgs [numPressureResources][numPressureStates][len(pressureAvgWindows)]float64
+
+	// avgLast is the time in nanoseconds at which avgs were last updated,
+	// and avgTotal is total at that time.
+	avgLast  int64
+	avgTotal [numPressureResources][numPressureStates]time.Duration
+
+	// avgNext is the time in nanoseconds at which avgs are next updated.
+	avgNext int64
+
+	// triggers are the registered PressureTriggers.
+	triggers map[*PressureTrigger]struct{}
+}
+
+// PressureTrigger notifies waiters with EventPri when stall time on a resource
+// exceeds a threshold within a time window, as written to a file in
+// /proc/pressure.
+//
+// +stateify savable
+type PressureTrigger struct {
+	// queue is notified of events. queue is immutable.
+	queue *waiter.Queue
+
+	// res, state, threshold and window are immutable.
+	res       PressureResource
+	state     int
+	threshold time.Duration
+	window    time.Duration
+
+	// The remaining fields are protected by pressureState.mu.
+
+	// winStart is the time in nanoseconds at which the current window
+	// started, and winStartTotal is the stall total at that time.
+	winStart      int64
+	winStartTotal time.Duration
+
+	// prevGrowth is the stall growth during the previous window.
+	prevGrowth time.Duration
+
+	// lastEvent is the time in nanoseconds of the last event.
+	lastEvent int64
+
+	// pending is true if an event has occurred that hasn't been consumed by
+	// Readiness.
+	pending bool
+}
+
+// PressureLine contains one line of a pressure file.
+type PressureLine struct {
+	// Avgs are the avg10, avg60 and avg300 values, as percentages.
+	Avgs [len(pressureAvgWindows)]float64
+
+	// Total is the cumulative stall time.
+	Total time.Duration
+}
+
+// PressureStats contains the contents of a pressure file.
+type PressureStats struct {
+	Some PressureLine
+	Full PressureLine
+}
+
+// WriteTo writes s to buf in the format of /proc/pressure files.
+func (s *PressureStats) WriteTo(buf *bytes.Buffer) {
+	for _, l := range []struct {
+		name string
+		line *PressureLine
+	}{{"some", &s.Some}, {"full", &s.Full}} {
+		fmt.Fprintf(buf, "%s avg10=%.2f avg60=%.2f avg300=%.2f total=%d\n", l.name, l.line.Avgs[0], l.line.Avgs[1], l.line.Avgs[2], l.line.Total.Microseconds())
+	}
+}
+
+// PressureStats returns the pressure stall information for res.
+func (k *Kernel) PressureStats(res PressureResource) PressureStats {
+	p := &k.pressure
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updateLocked(k)
+	return PressureStats{
+		Some: PressureLine{Avgs: p.avgs[res][pressureSome], Total: p.total[res][pressureSome]},
+		Full: PressureLine{Avgs: p.avgs[res][pressureFull], Total: p.total[res][pressureFull]},
+	}
+}
+
+// NewPressureTrigger parses a trigger written to a pressure file, e.g. "some
+// 150000 1000000", and registers it. Events are notified to queue. The caller
+// must call DestroyPressureTrigger when the trigger is no longer needed.
+func (k *Kernel) NewPressureTrigger(res PressureResource, spec string, queue *waiter.Queue) (*PressureTrigger, error) {
+	var (
+		stateName          string
+		thresholdUS, winUS uint32
+	)
+	if n, _ := fmt.Sscanf(spec, "%s %d %d", &stateName, &thresholdUS, &winUS); n != 3 {
+		return nil, linuxerr.EINVAL
+	}
+	var state int
+	switch stateName {
+	case "some":
+		state = pressureSome
+	case "full":
+		state = pressureFull
+	default:
+		return nil, linuxerr.EINVAL
+	}
+	threshold := time.Duration(thresholdUS) * time.Microsecond
+	window := time.Duration(winUS) * time.Microsecond
+	if window < pressureWindowMin || window > pressureWindowMax || threshold == 0 || threshold > window {
+		return nil, linuxerr.EINVAL
+	}
+
+	p := &k.pressure
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updateLocked(k)
+	tr := &PressureTrigger{
+		queue:         queue,
+		res:           res,
+		state:         state,
+		threshold:     threshold,
+		window:        window,
+		winStart:      p.lastUpdate,
+		winStartTotal: p.total[res][state],
+	}
+	if p.triggers == nil {
+		p.triggers = make(map[*PressureTrigger]struct{})
+	}
+	p.triggers[tr] = struct{}{}
+	return tr, nil
+}
+
+// DestroyPressureTrigger unregisters tr.
+func (k *Kernel) DestroyPressureTrigger(tr *PressureTrigger) {
+	p := &k.pressure
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.triggers, tr)
+}
+
+// PressureTriggerReadiness returns EventPri if an event has occurred on tr
+// since the last call to PressureTriggerReadiness, consuming the event, as in Linux's psi_trigger_poll().
+func (k *Kernel) PressureTriggerReadiness(tr *PressureTrigger, mask waiter.EventMask) waiter.EventMask {
+	if mask&waiter.EventPri == 0 {
+		return 0
+	}
+	p := &k.pressure
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !tr.pending {
+		return 0
+	}
+	tr.pending = false
+	return waiter.EventPri
+}
+
+// memStallBegin is called when a task starts to stall on memory.
+func (p *pressureState) memStallBegin(k *Kernel) {
+	if p.memStalled.Add(1) == 1 {
+		p.update(k)
+	}
+}
+
+// memStallEnd is called when a task stops stalling on memory.
+func (p *pressureState) memStallEnd(k *Kernel) {
+	if p.memStalled.Add(-1) == 0 {
+		p.update(k)
+	}
+}
+
+// cpuThrottleBegin is called when a task is throttled.
+func (p *pressureState) cpuThrottleBegin(k *Kernel) {
+	p.cpuThrottled.Add(1)
+	p.update(k)
+}
+
+// cpuThrottleEnd is called when a task stops being throttled.
+func (p *pressureState) cpuThrottleEnd(k *Kernel) {
+	p.cpuThrottled.Add(-1)
+	p.update(k)
+}
+
+// update attributes the time since the last update to the stall states
+// observed then, and observes the current stall states.
+func (p *pressureState) update(k *Kernel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updateLocked(k)
+}
+
+// Preconditions: p.mu must be locked.
+func (p *pressureState) updateLocked(k *Kernel) {
+	now := k.MonotonicClock().Now().Nanoseconds()
+	if d := now - p.lastUpdate; p.lastUpdate != 0 && d > 0 {
+		for res := range p.stalled {
+			for state, stalled := range p.stalled[res] {
+				if stalled {
+					p.total[res][state] += time.Duration(d)
+				}
+			}
+		}
+	}
+	p.lastUpdate = now
+
+	running := k.runningTasks.Load()
+	memStalled := p.memStalled.Load()
+	cpuThrottled := p.cpuThrottled.Load()
+	cpuWaiting := cpuThrottled
+	if excess := running - int64(k.applicationCores.Load()); excess > 0 {
+		cpuWaiting += excess
+	}
+	p.stalled[PressureMemory][pressureSome] = memStalled > 0
+	// Tasks handling page faults are counted as running, so memory is fully
+	// stalled when there are no other running or throttled tasks.
+	p.stalled[PressureMemory][pressureFull] = memStalled > 0 && running <= memStalled && cpuThrottled == 0
+	p.stalled[PressureCPU][pressureSome] = cpuWaiting > 0
+	// As in Linux, "full" CPU pressure is undefined at the system level and
+	// always reported as zero.
+
+	p.updateAvgsLocked(now)
+	for tr := range p.triggers {
+		tr.updateLocked(now, p.total[tr.res][tr.state])
+	}
+}
+
+// Preconditions: p.mu must be locked.
+func (p *pressureState) updateAvgsLocked(now int64) {
+	if p.avgNext == 0 {
+		p.avgLast = now
+		p.avgNext = now + int64(pressureAvgPeriod)
+		return
+	}
+	if now < p.avgNext {
+		return
+	}
+	// If periods were missed because nothing called update, the stall time
+	// is assumed to have been spread evenly across them.
+	periods := 1 + (now-p.avgNext)/int64(pressureAvgPeriod)
+	elapsed := float64(now - p.avgLast)
+	for res := range p.avgs {
+		for state := range p.avgs[res] {
+			pct := 100 * float64(p.total[res][state]-p.avgTotal[res][state]) / elapsed
+			if pct > 100 {
+				pct = 100
+			}
+			for i, window := range pressureAvgWindows {
+				decay := math.Exp(-float64(periods) * float64(pressureAvgPeriod) / float64(window))
+				p.avgs[res][state][i] = p.avgs[res][state][i]*decay + pct*(1-decay)
+			}
+		}
+	}
+	p.avgTotal = p.total
+	p.avgLast = now
+	p.avgNext += periods * int64(pressureAvgPeriod)
+}
+
+// updateLocked checks whether the stall time has grown by more than
+// tr.threshold within the trigger's window, as in Linux's
+// kernel/sched/psi.c:window_update().
+//
+// Preconditions: pressureState.mu must be locked.
+func (tr *PressureTrigger) updateLocked(now int64, total time.Duration) {
+	elapsed := time.Duration(now - tr.winStart)
+	if elapsed >= tr.window {
+		tr.prevGrowth = total - tr.winStartTotal
+		tr.winStart = now
+		tr.winStartTotal = total
+		elapsed = 0
+	}
+	// Add the growth that occurred in the part of the previous window that
+	// overlaps a window ending now, assuming it was spread evenly.
+	growth := total - tr.winStartTotal
+	growth += time.Duration(float64(tr.prevGrowth) * float64(tr.window-elapsed) / float64(tr.window))
+	if growth < tr.threshold {
+		return
+	}
+	// Limit events to one per window.
+	if tr.lastEvent != 0 && now < tr.lastEvent+int64(tr.window) {
+		return
+	}
+	tr.lastEvent = now
+	tr.pending = true
+	tr.queue.Notify(waiter.EventPri)
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+func TestPressureAverages(t *testing.T) {
+	var p pressureState
+	now := int64(time.Hour)
+	p.updateAvgsLocked(now)
+
+	// Stall for half of each period for 10 seconds.
+	for i := 0; i < 5; i++ {
+		p.total[PressureMemory][pressureSome] += pressureAvgPeriod / 2
+		now += int64(pressureAvgPeriod)
+		p.updateAvgsLocked(now)
+	}
+	avgs := p.avgs[PressureMemory][pressureSome]
+	// avg10 should have covered 1-1/e of the distance to 50%.
+	if want := 50 * (1 - math.Exp(-1)); math.Abs(avgs[0]-want) > 0.01 {
+		t.Errorf("avg10: got %.2f, want %.2f", avgs[0], want)
+	}
+	if !(avgs[2] < avgs[1] && avgs[1] < avgs[0]) {
+		t.Errorf("got averages %v, want longer windows to be lower", avgs)
+	}
+	if got := p.avgs[PressureMemory][pressureFull]; got != [3]float64{} {
+		t.Errorf("got full averages %v, want zero", got)
+	}
+
+	// Missed periods are treated as one long period.
+	p.total[PressureMemory][pressureSome] += 5 * pressureAvgPeriod
+	now += int64(5 * pressureAvgPeriod)
+	p.updateAvgsLocked(now)
+	if avg10 := p.avgs[PressureMemory][pressureSome][0]; avg10 <= avgs[0] || avg10 > 100 {
+		t.Errorf("avg10 after full stall: got %.2f, want in (%.2f, 100]", avg10, avgs[0])
+	}
+}
+
+func TestPressureTrigger(t *testing.T) {
+	var q waiter.Queue
+	e, ch := waiter.NewChannelEntry(waiter.EventPri)
+	q.EventRegister(&e)
+	defer q.EventUnregister(&e)
+
+	tr := &PressureTrigger{
+		queue:     &q,
+		threshold: 100 * time.Millisecond,
+		window:    time.Second,
+	}
+	now := int64(time.Hour)
+	tr.winStart = now
+
+	// Growth below the threshold doesn't fire.
+	now += int64(500 * time.Millisecond)
+	tr.updateLocked(now, 50*time.Millisecond)
+	if tr.pending {
+		t.Fatalf("trigger fired below threshold")
+	}
+
+	// Growth above the threshold fires once.
+	now += int64(100 * time.Millisecond)
+	tr.updateLocked(now, 150*time.Millisecond)
+	if !tr.pending {
+		t.Fatalf("trigger didn't fire above threshold")
+	}
+	select {
+	case <-ch:
+	default:
+		t.Errorf("queue wasn't notified")
+	}
+	tr.pending = false
+
+	// Events are limited to one per window.
+	now += int64(100 * time.Millisecond)
+	tr.updateLocked(now, 300*time.Millisecond)
+	if tr.pending {
+		t.Errorf("trigger fired twice within a window")
+	}
+	now += int64(time.Second)
+	tr.updateLocked(now, 500*time.Millisecond)
+	if !tr.pending {
+		t.Errorf("trigger didn't fire in the next window")
+	}
+}
+
+func TestPressureStatsWriteTo(t *testing.T) {
+	s := PressureStats{
+		Some: PressureLine{Avgs: [3]float64{1.5, 0.25, 0}, Total: 1234 * time.Microsecond},
+	}
+	var buf bytes.Buffer
+	s.WriteTo(&buf)
+	want := "some avg10=1.50 avg60=0.25 avg300=0.00 total=1234\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -1001,17 +1001,18 @@ func (t *Task) ptraceSetOptionsLocked(opts uintptr) error {
 	return nil
 }
 
-// Ptrace implements the ptrace system call.
-func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
+// Ptrace implements the ptrace system call. It returns the system call's
+// return value, which is 0 for all requests except PTRACE_PEEKSIGINFO.
+func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) (uintptr, error) {
 	// PTRACE_TRACEME ignores all other arguments.
 	if req == linux.PTRACE_TRACEME {
-		return t.ptraceTraceme()
+		return 0, t.ptraceTraceme()
 	}
 	// All other ptrace requests operate on a current or future tracee
 	// specified by pid.
 	target := t.tg.pidns.TaskWithID(pid)
 	if target == nil {
-		return linuxerr.ESRCH
+		return 0, linuxerr.ESRCH
 	}
 
 	// PTRACE_ATTACH and PTRACE_SEIZE do not require that target is not already
@@ -1019,24 +1020,24 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 	if req == linux.PTRACE_ATTACH || req == linux.PTRACE_SEIZE {
 		seize := req == linux.PTRACE_SEIZE
 		if seize && addr != 0 {
-			return linuxerr.EIO
+			return 0, linuxerr.EIO
 		}
-		return t.ptraceAttach(target, seize, uintptr(data))
+		return 0, t.ptraceAttach(target, seize, uintptr(data))
 	}
 	// PTRACE_KILL and PTRACE_INTERRUPT require that the target is a tracee,
 	// but does not require that it is ptrace-stopped.
 	if req == linux.PTRACE_KILL {
-		return t.ptraceKill(target)
+		return 0, t.ptraceKill(target)
 	}
 	if req == linux.PTRACE_INTERRUPT {
-		return t.ptraceInterrupt(target)
+		return 0, t.ptraceInterrupt(target)
 	}
 	// All other ptrace requests require that the target is a ptrace-stopped
 	// tracee, and freeze the ptrace-stop so the tracee can be operated on.
 	t.tg.pidns.owner.mu.RLock()
 	if target.Tracer() != t {
 		t.tg.pidns.owner.mu.RUnlock()
-		return linuxerr.ESRCH
+		return 0, linuxerr.ESRCH
 	}
 	if !target.ptraceFreeze() {
 		t.tg.pidns.owner.mu.RUnlock()
@@ -1044,7 +1045,7 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 		// PTRACE_TRACEME, PTRACE_INTERRUPT, and PTRACE_KILL) require the
 		// tracee to be in a ptrace-stop, otherwise they fail with ESRCH." -
 		// ptrace(2)
-		return linuxerr.ESRCH
+		return 0, linuxerr.ESRCH
 	}
 	t.tg.pidns.owner.mu.RUnlock()
 	// Even if the target has a ptrace-stop active, the tracee's task goroutine
@@ -1066,56 +1067,56 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 	case linux.PTRACE_DETACH:
 		if err := t.ptraceDetach(target, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_CONT:
 		if err := target.ptraceUnstop(ptraceSyscallNone, false, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SYSCALL:
 		if err := target.ptraceUnstop(ptraceSyscallIntercept, false, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SINGLESTEP:
 		if err := target.ptraceUnstop(ptraceSyscallNone, true, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SYSEMU:
 		if err := target.ptraceUnstop(ptraceSyscallEmu, false, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SYSEMU_SINGLESTEP:
 		if err := target.ptraceUnstop(ptraceSyscallEmu, true, linux.Signal(data)); err != nil {
 			target.ptraceUnfreeze()
-			return err
+			return 0, err
 		}
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_LISTEN:
 		t.tg.pidns.owner.mu.RLock()
 		defer t.tg.pidns.owner.mu.RUnlock()
 		if !target.ptraceSeized {
-			return linuxerr.EIO
+			return 0, linuxerr.EIO
 		}
 		if target.ptraceSiginfo == nil {
-			return linuxerr.EIO
+			return 0, linuxerr.EIO
 		}
 		if target.ptraceSiginfo.Code>>8 != linux.PTRACE_EVENT_STOP {
-			return linuxerr.EIO
+			return 0, linuxerr.EIO
 		}
 		target.tg.signalHandlers.mu.Lock()
 		defer target.tg.signalHandlers.mu.Unlock()
@@ -1125,7 +1126,7 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 			target.stop.(*ptraceStop).listen = true
 			target.ptraceUnfreezeLocked()
 		}
-		return nil
+		return 0, nil
 	}
 
 	// All other ptrace requests expect us to unfreeze the stop.
@@ -1139,15 +1140,15 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 		// is the error flag." - ptrace(2)
 		word := t.Arch().Native(0)
 		if _, err := word.CopyIn(target.CopyContext(t, usermem.IOOpts{IgnorePermissions: true}), addr); err != nil {
-			return err
+			return 0, err
 		}
 		_, err := word.CopyOut(t, data)
-		return err
+		return 0, err
 
 	case linux.PTRACE_POKETEXT, linux.PTRACE_POKEDATA:
 		word := t.Arch().Native(uintptr(data))
 		_, err := word.CopyOut(target.CopyContext(t, usermem.IOOpts{IgnorePermissions: true}), addr)
-		return err
+		return 0, err
 
 	case linux.PTRACE_GETREGSET:
 		// "Read the tracee's registers. addr specifies, in an
@@ -1157,10 +1158,13 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 		// to indicate the actual number of bytes returned." - ptrace(2)
 		ars, err := t.CopyInIovecs(data, 1)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
-		t.p.PullFullState(t.MemoryManager().AddressSpace(), t.Arch())
+		// The register set may include state, like the extended FPU state,
+		// that the platform only copies into the target's arch.Context on
+		// demand.
+		target.p.PullFullState(target.MemoryManager().AddressSpace(), target.Arch())
 
 		ar := ars.Head()
 		n, err := target.Arch().PtraceGetRegSet(uintptr(addr), &usermem.IOReadWriter{
@@ -1172,7 +1176,7 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 			},
 		}, int(ar.Length()), target.Kernel().FeatureSet())
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		// Update iovecs to represent the range of the written register set.
@@ -1181,89 +1185,127 @@ func (t *Task) Ptrace(req int64, pid ThreadID, addr, data hostarch.Addr) error {
 			panic(fmt.Sprintf("%#x + %#x overflows. Invalid reg size > %#x", ar.Start, n, ar.Length()))
 		}
 		ar.End = end
-		return t.CopyOutIovecs(data, hostarch.AddrRangeSeqOf(ar))
+		return 0, t.CopyOutIovecs(data, hostarch.AddrRangeSeqOf(ar))
 
 	case linux.PTRACE_SETREGSET:
 		ars, err := t.CopyInIovecs(data, 1)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
-		mm := t.MemoryManager()
-		t.p.PullFullState(mm.AddressSpace(), t.Arch())
+		target.p.PullFullState(target.MemoryManager().AddressSpace(), target.Arch())
 
 		ar := ars.Head()
 		n, err := target.Arch().PtraceSetRegSet(uintptr(addr), &usermem.IOReadWriter{
 			Ctx:  t,
-			IO:   mm,
+			IO:   t.MemoryManager(),
 			Addr: ar.Start,
 			Opts: usermem.IOOpts{
 				AddressSpaceActive: true,
 			},
 		}, int(ar.Length()), target.Kernel().FeatureSet())
 		if err != nil {
-			return err
+			return 0, err
 		}
-		t.p.FullStateChanged()
+		target.p.FullStateChanged()
 		ar.End -= hostarch.Addr(n)
-		return t.CopyOutIovecs(data, hostarch.AddrRangeSeqOf(ar))
+		return 0, t.CopyOutIovecs(data, hostarch.AddrRangeSeqOf(ar))
 
 	case linux.PTRACE_GETSIGINFO:
 		t.tg.pidns.owner.mu.RLock()
 		defer t.tg.pidns.owner.mu.RUnlock()
 		if target.ptraceSiginfo == nil {
-			return linuxerr.EINVAL
+			return 0, linuxerr.EINVAL
 		}
 		_, err := target.ptraceSiginfo.CopyOut(t, data)
-		return err
+		return 0, err
 
 	case linux.PTRACE_SETSIGINFO:
 		var info linux.SignalInfo
 		if _, err := info.CopyIn(t, data); err != nil {
-			return err
+			return 0, err
 		}
 		t.tg.pidns.owner.mu.RLock()
 		defer t.tg.pidns.owner.mu.RUnlock()
 		if target.ptraceSiginfo == nil {
-			return linuxerr.EINVAL
+			return 0, linuxerr.EINVAL
 		}
 		target.ptraceSiginfo = &info
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_GETSIGMASK:
 		if addr != linux.SignalSetSize {
-			return linuxerr.EINVAL
+			return 0, linuxerr.EINVAL
 		}
 		mask := target.SignalMask()
 		_, err := mask.CopyOut(t, data)
-		return err
+		return 0, err
 
 	case linux.PTRACE_SETSIGMASK:
 		if addr != linux.SignalSetSize {
-			return linuxerr.EINVAL
+			return 0, linuxerr.EINVAL
 		}
 		var mask linux.SignalSet
 		if _, err := mask.CopyIn(t, data); err != nil {
-			return err
+			return 0, err
 		}
 		// The target's task goroutine is stopped, so this is safe:
 		target.SetSignalMask(mask &^ UnblockableSignals)
-		return nil
+		return 0, nil
 
 	case linux.PTRACE_SETOPTIONS:
 		t.tg.pidns.owner.mu.Lock()
 		defer t.tg.pidns.owner.mu.Unlock()
-		return target.ptraceSetOptionsLocked(uintptr(data))
+		return 0, target.ptraceSetOptionsLocked(uintptr(data))
 
 	case linux.PTRACE_GETEVENTMSG:
 		t.tg.pidns.owner.mu.RLock()
 		defer t.tg.pidns.owner.mu.RUnlock()
 		_, err := primitive.CopyUint64Out(t, hostarch.Addr(data), target.ptraceEventMsg)
-		return err
+		return 0, err
 
-	// PEEKSIGINFO is unimplemented but seems to have no users anywhere.
+	case linux.PTRACE_PEEKSIGINFO:
+		return t.ptracePeekSiginfo(target, addr, data)
 
 	default:
-		return t.ptraceArch(target, req, addr, data)
+		return 0, t.ptraceArch(target, req, addr, data)
+	}
+}
+
+// ptracePeekSiginfo implements ptrace(PTRACE_PEEKSIGINFO, target, addr,
+// data). It returns the number of siginfo_t copied out to data.
+//
+// Preconditions: target must be a tracee of t in a frozen ptrace stop.
+func (t *Task) ptracePeekSiginfo(target *Task, addr, data hostarch.Addr) (uintptr, error) {
+	var args linux.PtracePeekSiginfoArgs
+	if _, err := args.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	if args.Flags&^linux.PTRACE_PEEKSIGINFO_SHARED != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if args.Nr < 0 {
+		return 0, linuxerr.EINVAL
+	}
+
+	// target.tg.signalHandlers is stable because target is in a frozen
+	// ptrace-stop, preventing its thread group from completing execve.
+	target.tg.signalHandlers.mu.Lock()
+	var infos []linux.SignalInfo
+	if args.Flags&linux.PTRACE_PEEKSIGINFO_SHARED != 0 {
+		infos = target.tg.pendingSignals.peek(args.Off, int(args.Nr))
+	} else {
+		infos = target.pendingSignals.peek(args.Off, int(args.Nr))
+	}
+	target.tg.signalHandlers.mu.Unlock()
+
+	for i := range infos {
+		if _, err := infos[i].CopyOut(t, data+hostarch.Addr(i*infos[i].SizeBytes())); err != nil {
+			if i > 0 {
+				return uintptr(i), nil
+			}
+			return 0, err
+		}
 	}
+	return uintptr(len(infos)), nil
 }
@@ -53,8 +53,9 @@ func (t *Task) ptraceArch(target *Task, req int64, addr, data hostarch.Addr) err
 		return err
 
 	case linux.PTRACE_GETFPREGS:
+		target.p.PullFullState(target.MemoryManager().AddressSpace(), target.Arch())
 		s := target.Arch().FloatingPointData()
-		_, err := target.Arch().FloatingPointData().PtraceGetFPRegs(&usermem.IOReadWriter{
+		_, err := s.PtraceGetFPRegs(&usermem.IOReadWriter{
 			Ctx:  t,
 			IO:   t.MemoryManager(),
 			Addr: data,
@@ -76,16 +77,20 @@ func (t *Task) ptraceArch(target *Task, req int64, addr, data hostarch.Addr) err
 		return err
 
 	case linux.PTRACE_SETFPREGS:
+		target.p.PullFullState(target.MemoryManager().AddressSpace(), target.Arch())
 		s := target.Arch().FloatingPointData()
-		_, err := s.PtraceSetFPRegs(&usermem.IOReadWriter{
+		if _, err := s.PtraceSetFPRegs(&usermem.IOReadWriter{
 			Ctx:  t,
 			IO:   t.MemoryManager(),
 			Addr: data,
 			Opts: usermem.IOOpts{
 				AddressSpaceActive: true,
 			},
-		}, len(*s))
-		return err
+		}, len(*s)); err != nil {
+			return err
+		}
+		target.p.FullStateChanged()
+		return nil
 
 	default:
 		return linuxerr.EIO
@@ -0,0 +1,298 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// RSeqEnabled is set to true when restartable sequences are enabled. Added as
+// a global to allow easy access from the syscall table.
+var RSeqEnabled = false
+
+// rseqTimeslice is the number of CPU clock ticks for which a task may execute
+// application code on a virtual CPU before it is preempted.
+const rseqTimeslice = 1
+
+// rseqCPUSet assigns virtual CPUs to tasks executing application code with
+// restartable sequences enabled.
+//
+// Neither the ptrace nor the KVM platform can tell when the host preempts or
+// migrates the thread executing a task, so the host CPU number is useless for
+// rseq: two tasks may see the same host CPU while both are inside critical
+// sections for the same per-CPU data. Instead, each task executing
+// application code holds one of Kernel.ApplicationCores() virtual CPUs
+// exclusively, and its rseq cpu_id is the number of that CPU. A task holds its
+// virtual CPU only for the duration of a platform.Context.Switch(); between
+// switches, the CPU may be taken by another task, in which case the first task
+// has been "preempted": its critical section, if any, is aborted and its
+// cpu_id updated before it next executes application code, as in Linux's
+// rseq_preempt() and rseq_migrate().
+//
+// At most Kernel.ApplicationCores() tasks execute application code
+// concurrently: tasks that can't acquire a virtual CPU wait for one, in FIFO
+// order. Tasks that hold a virtual CPU for rseqTimeslice CPU clock ticks are
+// preempted, as by a scheduler tick in Linux, which both shares CPUs between
+// waiting tasks and ensures that critical sections that loop indefinitely are
+// eventually aborted.
+type rseqCPUSet struct {
+	mu sync.Mutex
+
+	// cpus is the state of each virtual CPU. len(cpus) is the largest number
+	// of application cores since the rseqCPUSet was first used; CPUs at or
+	// above Kernel.ApplicationCores() are never assigned.
+	cpus []rseqCPU
+
+	// waiters is the queue of tasks waiting for a virtual CPU.
+	waiters []*rseqCPUWaiter
+
+	// released is broadcast when a virtual CPU is released.
+	released sync.Cond
+}
+
+// rseqCPU is the state of a virtual CPU.
+type rseqCPU struct {
+	// running is the task executing application code on the CPU, or nil if
+	// the CPU is idle.
+	running *Task
+
+	// mm is running's MemoryManager.
+	mm *mm.MemoryManager
+
+	// last is the last task to execute application code on the CPU, or nil
+	// if rseq critical sections of the last task must be aborted regardless.
+	last *Task
+
+	// since is the CPU clock tick at which running acquired the CPU.
+	since uint64
+
+	// seq is incremented each time the CPU is acquired.
+	seq uint64
+}
+
+// rseqCPUWaiter is a task waiting for a virtual CPU.
+type rseqCPUWaiter struct {
+	t       *Task
+	mm      *mm.MemoryManager
+	allowed sched.CPUSet
+
+	// cpu is the CPU assigned to the waiter, or -1 if the waiter hasn't been
+	// assigned a CPU. ready is closed when cpu is assigned.
+	cpu   int32
+	ready chan struct{}
+}
+
+// rseqUseCPUs returns true if t must hold a virtual CPU while executing
+// application code.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) rseqUseCPUs() bool {
+	return RSeqEnabled && (t.rseqAddr != 0 || t.oldRSeqCPUAddr != 0)
+}
+
+// rseqAcquireCPU assigns a virtual CPU to t, waiting for one to become
+// available if necessary. If another task has run on the assigned CPU since t
+// last did, t.rseqPreempted is set. If t is interrupted while waiting,
+// rseqAcquireCPU returns linuxerr.ErrInterrupted without assigning a CPU.
+//
+// Preconditions:
+//   - The caller must be running on the task goroutine.
+//   - t doesn't hold a virtual CPU.
+func (t *Task) rseqAcquireCPU() error {
+	s := &t.k.rseqCPUs
+	cores := int(t.k.ApplicationCores())
+	mm := t.MemoryManager()
+
+	t.mu.Lock()
+	s.mu.Lock()
+	if len(s.cpus) < cores {
+		s.cpus = append(s.cpus, make([]rseqCPU, cores-len(s.cpus))...)
+	}
+	cpu := int32(-1)
+	if len(s.waiters) == 0 {
+		// Prefer the CPU that t last ran on, followed by any other idle CPU
+		// that t is allowed to run on.
+		if prev := t.rseqCPU; prev >= 0 && int(prev) < cores && s.cpus[prev].running == nil && t.allowedCPUMask.IsSet(uint(prev)) {
+			cpu = prev
+		} else {
+			for i := 0; i < cores; i++ {
+				if s.cpus[i].running == nil && t.allowedCPUMask.IsSet(uint(i)) {
+					cpu = int32(i)
+					break
+				}
+			}
+		}
+	}
+	if cpu >= 0 {
+		s.assignLocked(t, mm, cpu)
+		s.mu.Unlock()
+		t.mu.Unlock()
+		t.rseqStartCPU(cpu)
+		return nil
+	}
+	w := &rseqCPUWaiter{
+		t:       t,
+		mm:      mm,
+		allowed: t.allowedCPUMask.Copy(),
+		cpu:     -1,
+		ready:   make(chan struct{}),
+	}
+	s.waiters = append(s.waiters, w)
+	s.mu.Unlock()
+	t.mu.Unlock()
+
+	if err := t.Block(w.ready); err != nil {
+		s.mu.Lock()
+		if w.cpu < 0 {
+			s.removeWaiterLocked(w)
+			s.mu.Unlock()
+			return err
+		}
+		s.mu.Unlock()
+		// We were assigned a CPU concurrently with being interrupted; pass
+		// it on.
+		t.rseqStartCPU(w.cpu)
+		t.rseqReleaseCPU()
+		return err
+	}
+	t.rseqStartCPU(w.cpu)
+	return nil
+}
+
+// rseqStartCPU records that t has been assigned cpu.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) rseqStartCPU(cpu int32) {
+	s := &t.k.rseqCPUs
+	s.mu.Lock()
+	preempted := s.cpus[cpu].last != t
+	s.cpus[cpu].last = t
+	s.mu.Unlock()
+	if preempted || t.rseqCPU != cpu {
+		t.rseqPreempted = true
+	}
+	t.rseqHeldCPU = cpu
+	if !t.k.useHostCores {
+		t.cpu.Store(cpu)
+	}
+}
+
+// rseqReleaseCPU releases the virtual CPU held by t, if any.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) rseqReleaseCPU() {
+	cpu := t.rseqHeldCPU
+	if cpu < 0 {
+		return
+	}
+	t.rseqHeldCPU = -1
+	s := &t.k.rseqCPUs
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cpus[cpu].running = nil
+	s.cpus[cpu].mm = nil
+	s.released.Broadcast()
+	if int(cpu) >= int(t.k.ApplicationCores()) {
+		return
+	}
+	for _, w := range s.waiters {
+		if w.allowed.IsSet(uint(cpu)) {
+			s.removeWaiterLocked(w)
+			w.cpu = cpu
+			s.assignLocked(w.t, w.mm, cpu)
+			close(w.ready)
+			return
+		}
+	}
+}
+
+// Preconditions: s.mu must be locked. s.cpus[cpu] must be idle.
+func (s *rseqCPUSet) assignLocked(t *Task, mm *mm.MemoryManager, cpu int32) {
+	c := &s.cpus[cpu]
+	c.running = t
+	c.mm = mm
+	c.since = t.k.CPUClockNow()
+	c.seq++
+}
+
+// Preconditions: s.mu must be locked. w must be in s.waiters.
+func (s *rseqCPUSet) removeWaiterLocked(w *rseqCPUWaiter) {
+	for i, other := range s.waiters {
+		if other == w {
+			copy(s.waiters[i:], s.waiters[i+1:])
+			s.waiters[len(s.waiters)-1] = nil
+			s.waiters = s.waiters[:len(s.waiters)-1]
+			return
+		}
+	}
+}
+
+// tick is called on each CPU clock tick, and preempts tasks that have used up
+// their timeslice.
+func (s *rseqCPUSet) tick(now uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.cpus {
+		if c := &s.cpus[i]; c.running != nil && now-c.since >= rseqTimeslice {
+			c.last = nil
+			c.since = now
+			c.running.p.Interrupt()
+		}
+	}
+}
+
+// preemptMM aborts the rseq critical sections of all tasks using mm, as for
+// MEMBARRIER_CMD_PRIVATE_EXPEDITED_RSEQ. Tasks executing application code are
+// interrupted, and preemptMM waits for them to stop before returning.
+func (s *rseqCPUSet) preemptMM(mm *mm.MemoryManager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.released.L == nil {
+		s.released.L = &s.mu
+	}
+	type running struct {
+		cpu int
+		seq uint64
+	}
+	var wait []running
+	for i := range s.cpus {
+		c := &s.cpus[i]
+		// Tasks that last ran on a CPU may be inside a critical section;
+		// ensure that they abort it when they next run, whether or not they
+		// share mm, since tasks that use a different mm will simply update
+		// their cpu_id.
+		c.last = nil
+		if c.running != nil && c.mm == mm {
+			c.running.p.Interrupt()
+			wait = append(wait, running{cpu: i, seq: c.seq})
+		}
+	}
+	for _, r := range wait {
+		for c := &s.cpus[r.cpu]; c.running != nil && c.seq == r.seq; {
+			s.released.Wait()
+		}
+	}
+}
+
+// PreemptRSeq aborts the rseq critical sections of all tasks using t's
+// MemoryManager, implementing MEMBARRIER_CMD_PRIVATE_EXPEDITED_RSEQ.
+//
+// Preconditions: t.RSeqAvailable() == true.
+func (t *Task) PreemptRSeq() error {
+	t.k.rseqCPUs.preemptMM(t.MemoryManager())
+	return nil
+}
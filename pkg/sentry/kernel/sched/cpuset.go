@@ -81,6 +81,12 @@ func (c *CPUSet) Set(cpu uint) {
 	(*c)[cpu/bitsPerByte] |= 1 << (cpu % bitsPerByte)
 }
 
+// IsSet returns true if the bit corresponding to cpu is set.
+func (c CPUSet) IsSet(cpu uint) bool {
+	i := cpu / bitsPerByte
+	return i < c.Size() && c[i]&(1<<(cpu%bitsPerByte)) != 0
+}
+
 // ClearAbove clears bits corresponding to cpu and all higher cpus.
 func (c *CPUSet) ClearAbove(cpu uint) {
 	i := cpu / bitsPerByte
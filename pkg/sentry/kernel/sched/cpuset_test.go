@@ -42,3 +42,16 @@ func TestClearAbove(t *testing.T) {
 		}
 	}
 }
+
+func TestIsSet(t *testing.T) {
+	const n = 64
+	c := NewCPUSet(n)
+	for i := uint(0); i < n; i += 3 {
+		c.Set(i)
+	}
+	for i := uint(0); i < 2*n; i++ {
+		if got, want := c.IsSet(i), i < n && i%3 == 0; got != want {
+			t.Errorf("IsSet(%d): got %t, wanted %t", i, got, want)
+		}
+	}
+}
@@ -51,14 +51,40 @@ func seccompSiginfo(t *Task, errno, sysno int32, ip hostarch.Addr) *linux.Signal
 	return si
 }
 
+// seccompFilter is a seccomp-bpf syscall filter.
+//
+// +stateify savable
+type seccompFilter struct {
+	// prog is the compiled filter program.
+	prog bpf.Program
+
+	// listener receives the notifications for syscalls for which prog
+	// returns SECCOMP_RET_USER_NOTIF. listener may be nil.
+	listener *SeccompListener
+}
+
 // checkSeccompSyscall applies the task's seccomp filters before the execution
 // of syscall sysno at instruction pointer ip. (These parameters must be passed
 // in because vsyscalls do not use the values in t.Arch().)
 //
 // Preconditions: The caller must be running on the task goroutine.
 func (t *Task) checkSeccompSyscall(sysno int32, args arch.SyscallArguments, ip hostarch.Addr) linux.BPFAction {
-	result := linux.BPFAction(t.evaluateSyscallFilters(sysno, args, ip))
-	action := result & linux.SECCOMP_RET_ACTION
+	data := linux.SeccompData{
+		Nr:                 sysno,
+		Arch:               t.image.st.AuditNumber,
+		InstructionPointer: uint64(ip),
+	}
+	// data.args is []uint64 and args is []arch.SyscallArgument (uintptr), so
+	// we can't do any slicing tricks or even use copy/append here.
+	for i, arg := range args {
+		if i >= len(data.Args) {
+			break
+		}
+		data.Args[i] = arg.Uint64()
+	}
+	ret, match := t.evaluateSyscallFilters(&data)
+	result := linux.BPFAction(ret)
+	action := result & linux.SECCOMP_RET_ACTION_FULL
 	switch action {
 	case linux.SECCOMP_RET_TRAP:
 		// "Results in the kernel sending a SIGSYS signal to the triggering
@@ -75,6 +101,18 @@ func (t *Task) checkSeccompSyscall(sysno int32, args arch.SyscallArguments, ip h
 		// userland as the errno without executing the system call."
 		t.Arch().SetReturn(-uintptr(result.Data()))
 
+	case linux.SECCOMP_RET_USER_NOTIF:
+		// "Forward the system call to an attached user-space supervisor
+		// process to allow that process to decide what to do with the system
+		// call. If there is no attached supervisor ..., then the filter
+		// returns ENOSYS" - seccomp(2)
+		if match.listener == nil {
+			tmp := uintptr(unix.ENOSYS)
+			t.Arch().SetReturn(-tmp)
+			return linux.SECCOMP_RET_ERRNO
+		}
+		return match.listener.notify(t, &data)
+
 	case linux.SECCOMP_RET_TRACE:
 		// "When returned, this value will cause the kernel to attempt to
 		// notify a ptrace()-based tracer prior to executing the system call.
@@ -87,9 +125,20 @@ func (t *Task) checkSeccompSyscall(sysno int32, args arch.SyscallArguments, ip h
 			return linux.SECCOMP_RET_ERRNO
 		}
 
+	case linux.SECCOMP_RET_LOG:
+		// "The system call is executed after the filter return action is
+		// logged." - seccomp(2)
+		t.Infof("Syscall %d: logged by seccomp", sysno)
+		return linux.SECCOMP_RET_ALLOW
+
 	case linux.SECCOMP_RET_ALLOW:
 		// "Results in the system call being executed."
 
+	case linux.SECCOMP_RET_KILL_PROCESS:
+		// "Results in the entire process exiting immediately without
+		// executing the system call. The exit status of the task ... will be
+		// SIGSYS, not SIGKILL." - seccomp(2)
+
 	case linux.SECCOMP_RET_KILL_THREAD:
 		// "Results in the task exiting immediately without executing the
 		// system call. The exit status of the task will be SIGSYS, not
@@ -102,32 +151,23 @@ func (t *Task) checkSeccompSyscall(sysno int32, args arch.SyscallArguments, ip h
 	return action
 }
 
-func (t *Task) evaluateSyscallFilters(sysno int32, args arch.SyscallArguments, ip hostarch.Addr) uint32 {
-	data := linux.SeccompData{
-		Nr:                 sysno,
-		Arch:               t.image.st.AuditNumber,
-		InstructionPointer: uint64(ip),
-	}
-	// data.args is []uint64 and args is []arch.SyscallArgument (uintptr), so
-	// we can't do any slicing tricks or even use copy/append here.
-	for i, arg := range args {
-		if i >= len(data.Args) {
-			break
-		}
-		data.Args[i] = arg.Uint64()
-	}
-	input := dataAsBPFInput(t, &data)
+// evaluateSyscallFilters returns the result of the task's seccomp filters for
+// data, and the filter that returned it.
+func (t *Task) evaluateSyscallFilters(data *linux.SeccompData) (uint32, seccompFilter) {
+	input := dataAsBPFInput(t, data)
 
 	ret := uint32(linux.SECCOMP_RET_ALLOW)
+	var match seccompFilter
 	f := t.syscallFilters.Load()
 	if f == nil {
-		return ret
+		return ret, match
 	}
 
 	// "Every filter successfully installed will be evaluated (in reverse
 	// order) for each system call the task makes." - kernel/seccomp.c
-	for i := len(f.([]bpf.Program)) - 1; i >= 0; i-- {
-		thisRet, err := bpf.Exec(f.([]bpf.Program)[i], input)
+	filters := f.([]seccompFilter)
+	for i := len(filters) - 1; i >= 0; i-- {
+		thisRet, err := bpf.Exec(filters[i].prog, input)
 		if err != nil {
 			t.Debugf("seccomp-bpf filter %d returned error: %v", i, err)
 			thisRet = uint32(linux.SECCOMP_RET_KILL_THREAD)
@@ -143,18 +183,25 @@ func (t *Task) evaluateSyscallFilters(sysno int32, args arch.SyscallArguments, i
 		// "The ordering ensures that a min_t() over composed return values
 		// always selects the least permissive choice." -
 		// include/uapi/linux/seccomp.h
-		if (thisRet & linux.SECCOMP_RET_ACTION) < (ret & linux.SECCOMP_RET_ACTION) {
+		//
+		// As in Linux's kernel/seccomp.c:ACTION_ONLY(), actions are compared
+		// as signed values so that SECCOMP_RET_KILL_PROCESS is the least
+		// permissive.
+		if int32(thisRet&linux.SECCOMP_RET_ACTION_FULL) < int32(ret&linux.SECCOMP_RET_ACTION_FULL) {
 			ret = thisRet
+			match = filters[i]
 		}
 	}
 
-	return ret
+	return ret, match
 }
 
-// AppendSyscallFilter adds BPF program p as a system call filter.
+// AppendSyscallFilter adds BPF program p as a system call filter. If listener
+// is not nil, it receives the notifications for syscalls for which p returns
+// SECCOMP_RET_USER_NOTIF.
 //
 // Preconditions: The caller must be running on the task goroutine.
-func (t *Task) AppendSyscallFilter(p bpf.Program, syncAll bool) error {
+func (t *Task) AppendSyscallFilter(p bpf.Program, syncAll bool, listener *SeccompListener) error {
 	// While syscallFilters are an atomic.Value we must take the mutex to prevent
 	// our read-copy-update from happening while another task is syncing syscall
 	// filters to us, this keeps the filters in a consistent state.
@@ -165,12 +212,17 @@ func (t *Task) AppendSyscallFilter(p bpf.Program, syncAll bool) error {
 	// instructions per filter beyond the first) to maxSyscallFilterInstructions.
 	// This restriction is inherited from Linux.
 	totalLength := p.Length()
-	var newFilters []bpf.Program
+	var newFilters []seccompFilter
 
 	if sf := t.syscallFilters.Load(); sf != nil {
-		oldFilters := sf.([]bpf.Program)
+		oldFilters := sf.([]seccompFilter)
 		for _, f := range oldFilters {
-			totalLength += f.Length() + 4
+			totalLength += f.prog.Length() + 4
+			// As in Linux's kernel/seccomp.c:has_duplicate_listener(), only
+			// one listener may be installed in a filter chain.
+			if listener != nil && f.listener != nil {
+				return linuxerr.EBUSY
+			}
 		}
 		newFilters = append(newFilters, oldFilters...)
 	}
@@ -179,14 +231,17 @@ func (t *Task) AppendSyscallFilter(p bpf.Program, syncAll bool) error {
 		return linuxerr.ENOMEM
 	}
 
-	newFilters = append(newFilters, p)
+	newFilters = append(newFilters, seccompFilter{
+		prog:     p,
+		listener: listener,
+	})
 	t.syscallFilters.Store(newFilters)
 
 	if syncAll {
 		// Note: No new privs is always assumed to be set.
 		for ot := t.tg.tasks.Front(); ot != nil; ot = ot.Next() {
 			if ot != t {
-				var copiedFilters []bpf.Program
+				var copiedFilters []seccompFilter
 				copiedFilters = append(copiedFilters, newFilters...)
 				ot.syscallFilters.Store(copiedFilters)
 			}
@@ -201,7 +256,7 @@ func (t *Task) AppendSyscallFilter(p bpf.Program, syncAll bool) error {
 // and /proc/[pid]/status.
 func (t *Task) SeccompMode() int {
 	f := t.syscallFilters.Load()
-	if f != nil && len(f.([]bpf.Program)) > 0 {
+	if f != nil && len(f.([]seccompFilter)) > 0 {
 		return linux.SECCOMP_MODE_FILTER
 	}
 	return linux.SECCOMP_MODE_NONE
@@ -0,0 +1,419 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// SeccompListener implements vfs.FileDescriptionImpl for seccomp user
+// notification listeners, as returned by seccomp(SECCOMP_SET_MODE_FILTER,
+// SECCOMP_FILTER_FLAG_NEW_LISTENER).
+//
+// Tasks whose filters return SECCOMP_RET_USER_NOTIF for a syscall are blocked
+// until the supervisor holding the listener responds to the notification, the
+// listener is closed, or the task is interrupted.
+//
+// +stateify savable
+type SeccompListener struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	// queue is notified when notifications are added or received.
+	queue waiter.Queue
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// nextID is the ID of the last notification.
+	nextID uint64
+
+	// notifications are the notifications that haven't been responded to, in
+	// the order in which they were sent. No notifications are pending when
+	// the kernel is saved, since blocked tasks are interrupted and restart
+	// their syscall after restore.
+	notifications []*seccompNotification `state:"nosave"`
+
+	// closed is true if the listener has been released.
+	closed bool
+}
+
+var _ vfs.FileDescriptionImpl = (*SeccompListener)(nil)
+
+// seccompNotification is a syscall of a task waiting for a response from the
+// supervisor.
+type seccompNotification struct {
+	id   uint64
+	task *Task
+	data linux.SeccompData
+
+	// received is true if the notification has been received by the
+	// supervisor.
+	received bool
+
+	// resp is the response to the notification. It's valid once ready is
+	// closed.
+	resp linux.SeccompNotifResp
+
+	// ready is closed once the notification has been responded to.
+	ready chan struct{}
+}
+
+// NewSeccompListener returns a new seccomp user notification listener.
+func NewSeccompListener(ctx context.Context, vfsObj *vfs.VirtualFilesystem) (*vfs.FileDescription, *SeccompListener, error) {
+	vd := vfsObj.NewAnonVirtualDentry("seccomp notify")
+	defer vd.DecRef(ctx)
+	l := &SeccompListener{}
+	if err := l.vfsfd.Init(l, linux.O_RDWR, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+		DenyPRead:         true,
+		DenyPWrite:        true,
+	}); err != nil {
+		return nil, nil, err
+	}
+	return &l.vfsfd, l, nil
+}
+
+// notify sends a notification for the syscall described by data to the
+// supervisor, and blocks t until it's responded to. It returns the action to
+// take for the syscall, like Task.checkSeccompSyscall.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (l *SeccompListener) notify(t *Task, data *linux.SeccompData) linux.BPFAction {
+	n := &seccompNotification{
+		task:  t,
+		data:  *data,
+		ready: make(chan struct{}),
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		tmp := uintptr(unix.ENOSYS)
+		t.Arch().SetReturn(-tmp)
+		return linux.SECCOMP_RET_ERRNO
+	}
+	l.nextID++
+	n.id = l.nextID
+	l.notifications = append(l.notifications, n)
+	l.mu.Unlock()
+	l.queue.Notify(waiter.ReadableEvents)
+
+	err := t.Block(n.ready)
+
+	l.mu.Lock()
+	select {
+	case <-n.ready:
+	default:
+		// We were interrupted before the supervisor responded. As in Linux,
+		// the notification is discarded, so that responding to it fails with
+		// ENOENT, and the syscall is restarted (re-evaluating the filters) if
+		// the task isn't killed.
+		l.removeLocked(n)
+		l.mu.Unlock()
+		t.Debugf("seccomp notification %d interrupted: %v", n.id, err)
+		t.Arch().SetReturn(uintptr(-ExtractErrno(linuxerr.ERESTARTSYS, -1)))
+		t.haveSyscallReturn = true
+		return linux.SECCOMP_RET_ERRNO
+	}
+	resp := n.resp
+	l.mu.Unlock()
+
+	if resp.Flags&linux.SECCOMP_USER_NOTIF_FLAG_CONTINUE != 0 {
+		return linux.SECCOMP_RET_ALLOW
+	}
+	if resp.Error != 0 {
+		t.Arch().SetReturn(uintptr(resp.Error))
+	} else {
+		t.Arch().SetReturn(uintptr(resp.Val))
+	}
+	return linux.SECCOMP_RET_ERRNO
+}
+
+// findLocked returns the pending notification with the given ID, or nil.
+//
+// Preconditions: l.mu must be locked.
+func (l *SeccompListener) findLocked(id uint64) *seccompNotification {
+	for _, n := range l.notifications {
+		if n.id == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// removeLocked removes n from the pending notifications.
+//
+// Preconditions: l.mu must be locked.
+func (l *SeccompListener) removeLocked(n *seccompNotification) {
+	for i, other := range l.notifications {
+		if other == n {
+			l.notifications = append(l.notifications[:i], l.notifications[i+1:]...)
+			return
+		}
+	}
+}
+
+// respondLocked responds to the pending notification n and wakes its task.
+//
+// Preconditions: l.mu must be locked.
+func (l *SeccompListener) respondLocked(n *seccompNotification, resp linux.SeccompNotifResp) {
+	n.resp = resp
+	l.removeLocked(n)
+	close(n.ready)
+}
+
+// receivedLocked returns the pending notification with the given ID if it has
+// been received by the supervisor, and an error otherwise.
+//
+// Preconditions: l.mu must be locked.
+func (l *SeccompListener) receivedLocked(id uint64) (*seccompNotification, error) {
+	n := l.findLocked(id)
+	if n == nil {
+		return nil, linuxerr.ENOENT
+	}
+	if !n.received {
+		return nil, linuxerr.EINPROGRESS
+	}
+	return n, nil
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (l *SeccompListener) Release(context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	// "If the supervisor closes the notification file descriptor, any
+	// pending notifications are failed with ENOSYS" - seccomp_unotify(2)
+	for len(l.notifications) > 0 {
+		l.respondLocked(l.notifications[0], linux.SeccompNotifResp{
+			Error: -int32(unix.ENOSYS),
+		})
+	}
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (l *SeccompListener) Readiness(mask waiter.EventMask) waiter.EventMask {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var ready waiter.EventMask
+	for _, n := range l.notifications {
+		if n.received {
+			ready |= waiter.WritableEvents
+		} else {
+			ready |= waiter.ReadableEvents
+		}
+	}
+	return mask & ready
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (l *SeccompListener) EventRegister(e *waiter.Entry) error {
+	l.queue.EventRegister(e)
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (l *SeccompListener) EventUnregister(e *waiter.Entry) {
+	l.queue.EventUnregister(e)
+}
+
+// Epollable implements FileDescriptionImpl.Epollable.
+func (l *SeccompListener) Epollable() bool {
+	return true
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (l *SeccompListener) Ioctl(ctx context.Context, uio usermem.IO, args arch.SyscallArguments) (uintptr, error) {
+	t := TaskFromContext(ctx)
+	if t == nil {
+		// Can't happen: ioctls are only called from tasks.
+		panic("Ioctl should be called from a task context")
+	}
+	addr := args[2].Pointer()
+	switch args[1].Uint() {
+	case linux.SECCOMP_IOCTL_NOTIF_RECV:
+		return 0, l.recv(t, addr)
+	case linux.SECCOMP_IOCTL_NOTIF_SEND:
+		var resp linux.SeccompNotifResp
+		if _, err := resp.CopyIn(t, addr); err != nil {
+			return 0, err
+		}
+		return 0, l.send(resp)
+	case linux.SECCOMP_IOCTL_NOTIF_ID_VALID, linux.SECCOMP_IOCTL_NOTIF_ID_VALID_WRONG_DIR:
+		var id primitive.Uint64
+		if _, err := id.CopyIn(t, addr); err != nil {
+			return 0, err
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if n := l.findLocked(uint64(id)); n == nil || !n.received {
+			return 0, linuxerr.ENOENT
+		}
+		return 0, nil
+	case linux.SECCOMP_IOCTL_NOTIF_ADDFD:
+		var addfd linux.SeccompNotifAddFD
+		if _, err := addfd.CopyIn(t, addr); err != nil {
+			return 0, err
+		}
+		return l.addFD(t, &addfd)
+	default:
+		return 0, linuxerr.EINVAL
+	}
+}
+
+// recv implements SECCOMP_IOCTL_NOTIF_RECV. As in Linux, it blocks until a
+// notification is available regardless of O_NONBLOCK.
+func (l *SeccompListener) recv(t *Task, addr hostarch.Addr) error {
+	var notif linux.SeccompNotif
+	if _, err := notif.CopyIn(t, addr); err != nil {
+		return err
+	}
+	// "The structure must be zeroed before the call." - seccomp_unotify(2)
+	if notif != (linux.SeccompNotif{}) {
+		return linuxerr.EINVAL
+	}
+
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	l.queue.EventRegister(&e)
+	defer l.queue.EventUnregister(&e)
+	var n *seccompNotification
+	for {
+		l.mu.Lock()
+		for _, other := range l.notifications {
+			if !other.received {
+				n = other
+				break
+			}
+		}
+		if n != nil {
+			n.received = true
+			notif = linux.SeccompNotif{
+				ID:   n.id,
+				Pid:  uint32(t.PIDNamespace().IDOfTask(n.task)),
+				Data: n.data,
+			}
+			l.mu.Unlock()
+			break
+		}
+		l.mu.Unlock()
+		if err := t.Block(ch); err != nil {
+			return linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+		}
+	}
+	l.queue.Notify(waiter.WritableEvents)
+
+	if _, err := notif.CopyOut(t, addr); err != nil {
+		// As in Linux, make the notification available again so that it's
+		// not lost.
+		l.mu.Lock()
+		n.received = false
+		l.mu.Unlock()
+		l.queue.Notify(waiter.ReadableEvents)
+		return err
+	}
+	return nil
+}
+
+// send implements SECCOMP_IOCTL_NOTIF_SEND.
+func (l *SeccompListener) send(resp linux.SeccompNotifResp) error {
+	if resp.Flags&^linux.SECCOMP_USER_NOTIF_FLAG_CONTINUE != 0 {
+		return linuxerr.EINVAL
+	}
+	if resp.Flags&linux.SECCOMP_USER_NOTIF_FLAG_CONTINUE != 0 && (resp.Error != 0 || resp.Val != 0) {
+		return linuxerr.EINVAL
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, err := l.receivedLocked(resp.ID)
+	if err != nil {
+		return err
+	}
+	l.respondLocked(n, resp)
+	return nil
+}
+
+// addFD implements SECCOMP_IOCTL_NOTIF_ADDFD. It installs a file of the
+// supervisor t in the file descriptor table of the task of a received
+// notification, and returns the new file descriptor.
+func (l *SeccompListener) addFD(t *Task, addfd *linux.SeccompNotifAddFD) (uintptr, error) {
+	if addfd.NewFDFlags&^linux.O_CLOEXEC != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if addfd.Flags&^(linux.SECCOMP_ADDFD_FLAG_SETFD|linux.SECCOMP_ADDFD_FLAG_SEND) != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if addfd.NewFD != 0 && addfd.Flags&linux.SECCOMP_ADDFD_FLAG_SETFD == 0 {
+		return 0, linuxerr.EINVAL
+	}
+
+	file := t.GetFileVFS2(int32(addfd.SrcFD))
+	if file == nil {
+		return 0, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+
+	// Holding l.mu prevents the target task from resuming until the file is
+	// installed.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, err := l.receivedLocked(addfd.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	var fdTable *FDTable
+	n.task.WithMuLocked(func(target *Task) {
+		if fdTable = target.fdTable; fdTable != nil {
+			fdTable.IncRef()
+		}
+	})
+	if fdTable == nil {
+		return 0, linuxerr.ENOENT
+	}
+	defer fdTable.DecRef(t)
+
+	// Resource limits are those of the target task.
+	ctx := n.task.AsyncContext()
+	flags := FDFlags{CloseOnExec: addfd.NewFDFlags&linux.O_CLOEXEC != 0}
+	fd := int32(addfd.NewFD)
+	if addfd.Flags&linux.SECCOMP_ADDFD_FLAG_SETFD != 0 {
+		err = fdTable.NewFDAtVFS2(ctx, fd, file, flags)
+	} else {
+		fd, err = fdTable.NewFDVFS2(ctx, 0, file, flags)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if addfd.Flags&linux.SECCOMP_ADDFD_FLAG_SEND != 0 {
+		l.respondLocked(n, linux.SeccompNotifResp{
+			ID:  n.id,
+			Val: int64(fd),
+		})
+	}
+	return uintptr(fd), nil
+}
@@ -17,6 +17,7 @@ package semaphore
 
 import (
 	"fmt"
+	"sort"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -207,6 +208,23 @@ func (r *Registry) HighestIndex() int32 {
 	return highestIndex
 }
 
+// Sets returns all sets in the registry, sorted by index.
+func (r *Registry) Sets() []*Set {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	indexes := make([]int32, 0, len(r.indexes))
+	for index := range r.indexes {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	sets := make([]*Set, 0, len(indexes))
+	for _, index := range indexes {
+		sets = append(sets, r.reg.FindByID(r.indexes[index]).(*Set))
+	}
+	return sets
+}
+
 // Remove removes set with give 'id' from the registry and marks the set as
 // dead. All waiters will be awakened and fail.
 func (r *Registry) Remove(id ipc.ID, creds *auth.Credentials) error {
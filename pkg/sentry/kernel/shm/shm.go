@@ -114,6 +114,33 @@ func (r *Registry) FindByID(id ipc.ID) *Shm {
 	return nil
 }
 
+// Segments returns all segments in the registry, sorted by ID.
+//
+// Segments returns a reference on each Shm.
+func (r *Registry) Segments() []*Shm {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	objs := r.reg.Objects()
+	segments := make([]*Shm, 0, len(objs))
+	for _, o := range objs {
+		// See FindByID.
+		if s := o.(*Shm); s.TryIncRef() {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// HighestIndex returns the index of the highest used entry in the kernel's
+// array of segments, as returned by shmctl(IPC_INFO) and shmctl(SHM_INFO).
+// Segments are not tracked in an array, so IDs are used as indices.
+func (r *Registry) HighestIndex() int32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int32(r.reg.HighestID())
+}
+
 // dissociateKey removes the association between a segment and its key,
 // preventing it from being discovered in the registry. This doesn't necessarily
 // mean the segment is about to be destroyed. This is analogous to unlinking a
@@ -251,7 +278,7 @@ func (r *Registry) ShmInfo() *linux.ShmInfo {
 	defer r.mu.Unlock()
 
 	return &linux.ShmInfo{
-		UsedIDs: int32(r.reg.LastIDUsed()),
+		UsedIDs: int32(r.reg.ObjectCount()),
 		ShmTot:  r.totalPages,
 		ShmRss:  r.totalPages, // We could probably get a better estimate from memory accounting.
 		ShmSwp:  0,            // No reclaim at the moment.
@@ -558,14 +585,30 @@ func (s *Shm) EffectiveSize() uint64 {
 }
 
 // IPCStat returns information about a shm. See shmctl(IPC_STAT).
+//
+// Preconditions: The caller must hold a reference on s.
 func (s *Shm) IPCStat(ctx context.Context) (*linux.ShmidDS, error) {
+	// "The caller must have read permission on the shared memory segment."
+	//   - man shmctl(2)
+	return s.stat(ctx, fs.PermMask{Read: true})
+}
+
+// IPCStatAny is similar to Shm.IPCStat, but doesn't require read permission.
+// See shmctl(SHM_STAT_ANY).
+//
+// Preconditions: The caller must hold a reference on s.
+func (s *Shm) IPCStatAny(ctx context.Context) (*linux.ShmidDS, error) {
+	return s.stat(ctx, fs.PermMask{})
+}
+
+// stat returns information about a shm. An error is returned if the caller
+// doesn't have the specified permissions.
+func (s *Shm) stat(ctx context.Context, mask fs.PermMask) (*linux.ShmidDS, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// "The caller must have read permission on the shared memory segment."
-	//   - man shmctl(2)
 	creds := auth.CredentialsFromContext(ctx)
-	if !s.obj.CheckPermissions(creds, fs.PermMask{Read: true}) {
+	if !s.obj.CheckPermissions(creds, mask) {
 		// "IPC_STAT or SHM_STAT is requested and shm_perm.mode does not allow
 		// read access for shmid, and the calling process does not have the
 		// CAP_IPC_OWNER capability in the user namespace that governs its IPC
@@ -0,0 +1,89 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/metric"
+)
+
+// syscallLatencyUnknown is the syscall field value of the syscall latency
+// metric for syscall numbers that are not in the syscall table.
+const syscallLatencyUnknown = "unknown"
+
+// syscallLatencyBucketer buckets syscall latencies exponentially from 1µs to
+// about 4s. The underflow bucket contains syscalls that took less than 1µs.
+var syscallLatencyBucketer = metric.NewExponentialBucketer(12, 0, float64(1000), 4)
+
+// syscallLatency records the time spent executing each syscall. It is nil
+// unless EnableSyscallLatencyMetric has been called, and is immutable
+// afterwards.
+var syscallLatency *metric.TimerMetric
+
+// syscallLatencyUnknownKey is the field key of syscallLatencyUnknown in
+// syscallLatency.
+var syscallLatencyUnknownKey int
+
+// EnableSyscallLatencyMetric registers the /kernel/syscall_latency metric,
+// which records a latency histogram for each syscall, labeled by syscall name,
+// and starts recording it in Task.executeSyscall.
+//
+// Preconditions:
+//   - All syscall tables have been registered.
+//   - No tasks have been started.
+func EnableSyscallLatencyMetric() error {
+	names := []string{syscallLatencyUnknown}
+	seen := map[string]struct{}{syscallLatencyUnknown: {}}
+	for _, s := range allSyscallTables {
+		for _, sc := range s.Table {
+			if _, ok := seen[sc.Name]; !ok {
+				seen[sc.Name] = struct{}{}
+				names = append(names, sc.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	m, err := metric.NewTimerMetric("/kernel/syscall_latency", syscallLatencyBucketer, "Time spent executing syscalls in the sentry, in nanoseconds, by syscall name.", metric.NewField("syscall", names))
+	if err != nil {
+		return err
+	}
+	// Look up the field key of each syscall ahead of time, so that recording a
+	// sample doesn't need to search the field values.
+	syscallLatencyUnknownKey = m.FieldKey(syscallLatencyUnknown)
+	for _, s := range allSyscallTables {
+		for num := range s.latencyKeys {
+			s.latencyKeys[num] = int32(syscallLatencyUnknownKey)
+		}
+		for num, sc := range s.Table {
+			s.latencyKeys[num] = int32(m.FieldKey(sc.Name))
+		}
+	}
+	syscallLatency = m
+	return nil
+}
+
+// recordSyscallLatency records that syscall sysno of table s took ns
+// nanoseconds.
+//
+// Preconditions: EnableSyscallLatencyMetric has been called.
+func (s *SyscallTable) recordSyscallLatency(sysno uintptr, ns int64) {
+	key := syscallLatencyUnknownKey
+	if sysno <= maxSyscallNum {
+		key = int(s.latencyKeys[sysno])
+	}
+	syscallLatency.AddSampleByKey(ns, key)
+}
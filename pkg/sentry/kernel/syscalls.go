@@ -309,6 +309,11 @@ type SyscallTable struct {
 	// seccheck.Point is enabled for the syscall.
 	pointCallbacks [maxSyscallNum + 1]SyscallToProto
 
+	// latencyKeys is a fixed-size array that holds the field keys of the
+	// syscall latency metric (indexed by syscall numbers). It is only
+	// initialized if EnableSyscallLatencyMetric has been called.
+	latencyKeys [maxSyscallNum + 1]int32
+
 	// Emulate is a collection of instruction addresses to emulate. The
 	// keys are addresses, and the values are system call numbers.
 	Emulate map[hostarch.Addr]uintptr
@@ -21,10 +21,10 @@ import (
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
-	"gvisor.dev/gvisor/pkg/bpf"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
@@ -240,6 +240,13 @@ type Task struct {
 	// syscallRestartBlock is exclusive to the task goroutine.
 	syscallRestartBlock SyscallRestartBlock
 
+	// unimplementedSyscallKill is set if the UnimplementedSyscallObserver
+	// requested that the task's thread group be killed by the current
+	// syscall. It is only set between the start and end of a syscall.
+	//
+	// unimplementedSyscallKill is exclusive to the task goroutine.
+	unimplementedSyscallKill bool `state:"nosave"`
+
 	// p provides the mechanism by which the task runs code in userspace. The p
 	// interface object is immutable.
 	p platform.Context `state:"nosave"`
@@ -254,6 +261,11 @@ type Task struct {
 	// NOTE: cgroups can be used to track this when implemented.
 	containerID string
 
+	// containerIO accounts and throttles the file I/O of the task's
+	// container. containerIO is nil if containerID is empty. It is
+	// immutable.
+	containerIO *usage.ContainerIO
+
 	// mu protects some of the following fields.
 	mu taskMutex `state:"nosave"`
 
@@ -424,6 +436,13 @@ type Task struct {
 	traceContext gocontext.Context `state:"nosave"`
 	traceTask    *trace.Task       `state:"nosave"`
 
+	// rng generates the task's random bytes, e.g. for getrandom(2). It's
+	// created on first use, so that children never share a generator with
+	// their parent, and isn't saved, so that it's reseeded after restore.
+	//
+	// rng is exclusive to the task goroutine.
+	rng *rand.Generator `state:"nosave"`
+
 	// creds is the task's credentials.
 	//
 	// creds.Load() may be called without synchronization. creds.Store() is
@@ -432,6 +451,12 @@ type Task struct {
 	// in the past, must be treated as immutable.
 	creds auth.AtomicPtrCredentials
 
+	// threadKeyring is the task's thread keyring, or nil if it has none. See
+	// thread-keyring(7).
+	//
+	// threadKeyring is protected by the TaskSet mutex.
+	threadKeyring *auth.Key
+
 	// utsns is the task's UTS namespace.
 	//
 	// utsns is protected by mu. utsns is owned by the task goroutine.
@@ -442,10 +467,18 @@ type Task struct {
 	// ipcns is protected by mu. ipcns is owned by the task goroutine.
 	ipcns *IPCNamespace
 
-	// abstractSockets tracks abstract sockets that are in use.
+	// timens is the task's time namespace.
 	//
-	// abstractSockets is protected by mu.
-	abstractSockets *AbstractSocketNamespace
+	// timens is protected by mu. timens is owned by the task goroutine.
+	timens *TimeNamespace
+
+	// timensForChildren is the time namespace that the task's children
+	// will enter, and that the task will enter on execve. It differs from
+	// timens after unshare(CLONE_NEWTIME).
+	//
+	// timensForChildren is protected by mu. timensForChildren is owned by
+	// the task goroutine.
+	timensForChildren *TimeNamespace
 
 	// mountNamespace is the task's mount namespace.
 	//
@@ -459,10 +492,10 @@ type Task struct {
 
 	// syscallFilters is all seccomp-bpf syscall filters applicable to the
 	// task, in the order in which they were installed. The type of the atomic
-	// is []bpf.Program. Writing needs to be protected by the signal mutex.
+	// is []seccompFilter. Writing needs to be protected by the signal mutex.
 	//
 	// syscallFilters is owned by the task goroutine.
-	syscallFilters atomic.Value `state:".([]bpf.Program)"`
+	syscallFilters atomic.Value `state:".([]seccompFilter)"`
 
 	// If cleartid is non-zero, treat it as a pointer to a ThreadID in the
 	// task's virtual address space; when the task exits, set the pointed-to
@@ -484,6 +517,16 @@ type Task struct {
 	// entirely if Kernel.useHostCores is true.
 	cpu atomicbitops.Int32
 
+	// If Kernel.hostCPUs is set, hostAffinityApplied is non-zero if the host
+	// affinity of the thread executing the task goroutine reflects
+	// allowedCPUMask, or hostAffinityCPU if it is not -1.
+	hostAffinityApplied atomicbitops.Uint32 `state:"nosave"`
+
+	// hostAffinityCPU is the virtual CPU whose host CPU the task goroutine's
+	// thread is pinned to, or -1 if the thread's affinity follows
+	// allowedCPUMask. hostAffinityCPU is exclusive to the task goroutine.
+	hostAffinityCPU int32 `state:"nosave"`
+
 	// This is used to keep track of changes made to a process' priority/niceness.
 	// It is mostly used to provide some reasonable return value from
 	// getpriority(2) after a call to setpriority(2) has been made.
@@ -495,15 +538,16 @@ type Task struct {
 	niceness int
 
 	// This is used to track the numa policy for the current thread. This can be
-	// modified through a set_mempolicy(2) syscall. Since we always report a
-	// single numa node, all policies are no-ops. We only track this information
-	// so that we can return reasonable values if the application calls
-	// get_mempolicy(2) after setting a non-default policy. Note that in the
-	// real syscall, nodemask can be longer than a single unsigned long, but we
-	// always report a single node so never need to save more than a single
-	// bit.
-	//
-	// numaPolicy and numaNodeMask are protected by mu.
+	// modified through a set_mempolicy(2) syscall. Unless the kernel's
+	// MemoryFile has a synthetic NUMA topology, we report a single numa node
+	// and all policies are no-ops; otherwise, the policy determines the node
+	// that private anonymous memory is allocated from. Note that in the real
+	// syscall, nodemask can be longer than a single unsigned long, but we
+	// report at most 64 nodes so never need to save more than a single
+	// unsigned long.
+	//
+	// numaPolicy and numaNodeMask are protected by mu, and are only mutated by
+	// the task goroutine.
 	numaPolicy   linux.NumaPolicy
 	numaNodeMask uint64
 
@@ -512,7 +556,7 @@ type Task struct {
 
 	// If rseqPreempted is true, before the next call to p.Switch(),
 	// interrupt rseq critical regions as defined by rseqAddr and
-	// tg.oldRSeqCritical and write the task goroutine's CPU number to
+	// tg.oldRSeqCritical and write the task's virtual CPU number to
 	// rseqAddr/oldRSeqCPUAddr.
 	//
 	// We support two ABIs for restartable sequences:
@@ -524,14 +568,18 @@ type Task struct {
 	// rseqPreempted is exclusive to the task goroutine.
 	rseqPreempted bool `state:"nosave"`
 
-	// rseqCPU is the last CPU number written to rseqAddr/oldRSeqCPUAddr.
-	//
-	// If rseq is unused, rseqCPU is -1 for convenient use in
-	// platform.Context.Switch.
+	// rseqCPU is the last CPU number written to rseqAddr/oldRSeqCPUAddr, or
+	// -1 if rseq is unused.
 	//
 	// rseqCPU is exclusive to the task goroutine.
 	rseqCPU int32
 
+	// rseqHeldCPU is the virtual CPU in Kernel.rseqCPUs held by the task
+	// while it executes application code, or -1 if it holds none.
+	//
+	// rseqHeldCPU is exclusive to the task goroutine.
+	rseqHeldCPU int32 `state:"nosave"`
+
 	// oldRSeqCPUAddr is a pointer to the userspace old rseq CPU variable.
 	//
 	// oldRSeqCPUAddr is exclusive to the task goroutine.
@@ -548,6 +596,10 @@ type Task struct {
 	// rseqSignature is exclusive to the task goroutine.
 	rseqSignature uint32
 
+	// personality is the task's execution domain and flags, as for
+	// personality(2). personality is only mutated by the task goroutine.
+	personality atomicbitops.Uint32
+
 	// copyScratchBuffer is a buffer available to CopyIn/CopyOut
 	// implementations that require an intermediate buffer to copy data
 	// into/out of. It prevents these buffers from being allocated/zeroed in
@@ -594,6 +646,14 @@ type Task struct {
 	// The userCounters pointer is exclusive to the task goroutine, but the
 	// userCounters instance must be atomically accessed.
 	userCounters *userCounters
+
+	// nprocExceeded is set when the task's real UID changes to a user that
+	// is over its RLIMIT_NPROC, in which case the next execve fails with
+	// EAGAIN if the user is still over the limit. This is equivalent to
+	// Linux's PF_NPROC_EXCEEDED.
+	//
+	// nprocExceeded is exclusive to the task goroutine.
+	nprocExceeded bool
 }
 
 // Task related metrics
@@ -617,14 +677,14 @@ func (t *Task) loadPtraceTracer(tracer *Task) {
 	t.ptraceTracer.Store(tracer)
 }
 
-func (t *Task) saveSyscallFilters() []bpf.Program {
+func (t *Task) saveSyscallFilters() []seccompFilter {
 	if f := t.syscallFilters.Load(); f != nil {
-		return f.([]bpf.Program)
+		return f.([]seccompFilter)
 	}
 	return nil
 }
 
-func (t *Task) loadSyscallFilters(filters []bpf.Program) {
+func (t *Task) loadSyscallFilters(filters []seccompFilter) {
 	t.syscallFilters.Store(filters)
 }
 
@@ -638,6 +698,7 @@ func (t *Task) afterLoad() {
 	}
 	t.endStopCond.L = &t.tg.signalHandlers.mu
 	t.rseqPreempted = true
+	t.rseqHeldCPU = -1
 	t.futexWaiter = futex.NewWaiter()
 	t.p = t.k.Platform.NewContext(t.AsyncContext())
 }
@@ -659,6 +720,17 @@ func (t *Task) CopyScratchBuffer(size int) []byte {
 	return t.copyScratchBuffer[:size]
 }
 
+// Random returns the task's random number generator, which is seeded from the
+// host on first use.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) Random() *rand.Generator {
+	if t.rng == nil {
+		t.rng = &rand.Generator{}
+	}
+	return t.rng
+}
+
 // FutexWaiter returns the Task's futex.Waiter.
 func (t *Task) FutexWaiter() *futex.Waiter {
 	return t.futexWaiter
@@ -832,9 +904,10 @@ func (t *Task) MountNamespaceVFS2() *vfs.MountNamespace {
 	return t.mountNamespace
 }
 
-// AbstractSockets returns t's AbstractSocketNamespace.
-func (t *Task) AbstractSockets() *AbstractSocketNamespace {
-	return t.abstractSockets
+// AbstractSockets returns the AbstractSocketNamespace of t's network
+// namespace.
+func (t *Task) AbstractSockets() *inet.AbstractSocketNamespace {
+	return t.NetworkNamespace().AbstractSockets()
 }
 
 // ContainerID returns t's container ID.
@@ -867,6 +940,18 @@ func (t *Task) KGID() uint32 {
 	return uint32(t.Credentials().EffectiveKGID)
 }
 
+// Personality returns t's personality, as for personality(2).
+func (t *Task) Personality() uint32 {
+	return t.personality.Load()
+}
+
+// SetPersonality sets t's personality, as for personality(2).
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) SetPersonality(p uint32) {
+	t.personality.Store(p)
+}
+
 // SetKcov sets the kcov instance associated with t.
 func (t *Task) SetKcov(k *Kcov) {
 	t.kcov = k
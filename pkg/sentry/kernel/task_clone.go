@@ -17,11 +17,12 @@ package kernel
 import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
-	"gvisor.dev/gvisor/pkg/bpf"
 	"gvisor.dev/gvisor/pkg/cleanup"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/loader"
 	"gvisor.dev/gvisor/pkg/sentry/seccheck"
 	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
 	"gvisor.dev/gvisor/pkg/usermem"
@@ -58,6 +59,11 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 	if args.Flags&linux.CLONE_NEWUSER != 0 && args.Flags&(linux.CLONE_THREAD|linux.CLONE_FS) != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
+	// pidfds refer to thread groups. CLONE_DETACHED is rejected along with
+	// CLONE_PIDFD since it's ignored by clone(2) on old kernels.
+	if args.Flags&linux.CLONE_PIDFD != 0 && args.Flags&(linux.CLONE_THREAD|linux.CLONE_DETACHED) != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
 	// args.ExitSignal must be a valid signal.
 	if args.ExitSignal != 0 && !linux.Signal(args.ExitSignal).IsValid() {
 		return 0, nil, linuxerr.EINVAL
@@ -89,10 +95,22 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 			return 0, nil, err
 		}
 	}
-	if args.Flags&(linux.CLONE_NEWPID|linux.CLONE_NEWNET|linux.CLONE_NEWUTS|linux.CLONE_NEWIPC) != 0 && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, userns) {
+	if args.Flags&(linux.CLONE_NEWPID|linux.CLONE_NEWNET|linux.CLONE_NEWUTS|linux.CLONE_NEWIPC|linux.CLONE_NEWTIME) != 0 && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, userns) {
 		return 0, nil, linuxerr.EPERM
 	}
 
+	// The child enters the time namespace for the caller's children, or a
+	// new one for CLONE_NEWTIME. Tasks sharing an address space must be in
+	// the same time namespace, since the VDSO param page is per address
+	// space; compare Linux's kernel/nsproxy.c:copy_namespaces().
+	timens := t.TimeNamespaceForChildren()
+	if args.Flags&linux.CLONE_NEWTIME != 0 {
+		timens = timens.NewChild(userns)
+	}
+	if args.Flags&linux.CLONE_VM != 0 && timens != t.TimeNamespace() {
+		return 0, nil, linuxerr.EINVAL
+	}
+
 	utsns := t.UTSNamespace()
 	if args.Flags&linux.CLONE_NEWUTS != 0 {
 		// Note that this must happen after NewUserNamespace so we get
@@ -138,6 +156,13 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 	cu.Add(func() {
 		image.release()
 	})
+	if timens != t.TimeNamespace() {
+		if disable := timens.HasOffsets(); disable != t.TimeNamespace().HasOffsets() {
+			if err := loader.RemapVDSOParamPage(t, image.MemoryManager, t.k.vdso, disable); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
 	// clone() returns 0 in the child.
 	image.Arch.SetReturn(0)
 	if args.Stack != 0 {
@@ -180,11 +205,16 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 			tg.mounts.IncRef()
 		}
 		sh := t.tg.signalHandlers
-		if args.Flags&linux.CLONE_SIGHAND == 0 {
+		if args.Flags&linux.CLONE_CLEAR_SIGHAND != 0 {
+			// Handled signals are reset to their default action, as
+			// in execve.
+			sh = sh.CopyForExec()
+		} else if args.Flags&linux.CLONE_SIGHAND == 0 {
 			sh = sh.Fork()
 		}
 		tg = t.k.NewThreadGroup(tg.mounts, pidns, sh, linux.Signal(args.ExitSignal), tg.limits.GetCopy())
 		tg.oomScoreAdj = atomicbitops.FromInt32(t.tg.oomScoreAdj.Load())
+		tg.limitGroup = t.tg.limitGroup
 		rseqAddr = t.rseqAddr
 		rseqSignature = t.rseqSignature
 	}
@@ -195,24 +225,25 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 	}
 
 	cfg := &TaskConfig{
-		Kernel:                  t.k,
-		ThreadGroup:             tg,
-		SignalMask:              t.SignalMask(),
-		TaskImage:               image,
-		FSContext:               fsContext,
-		FDTable:                 fdTable,
-		Credentials:             creds,
-		Niceness:                t.Niceness(),
-		NetworkNamespace:        netns,
-		AllowedCPUMask:          t.CPUMask(),
-		UTSNamespace:            utsns,
-		IPCNamespace:            ipcns,
-		AbstractSocketNamespace: t.abstractSockets,
-		MountNamespace:          mntns,
-		RSeqAddr:                rseqAddr,
-		RSeqSignature:           rseqSignature,
-		ContainerID:             t.ContainerID(),
-		UserCounters:            uc,
+		Kernel:           t.k,
+		ThreadGroup:      tg,
+		SignalMask:       t.SignalMask(),
+		TaskImage:        image,
+		FSContext:        fsContext,
+		FDTable:          fdTable,
+		Credentials:      creds,
+		Niceness:         t.Niceness(),
+		NetworkNamespace: netns,
+		AllowedCPUMask:   t.CPUMask(),
+		UTSNamespace:     utsns,
+		IPCNamespace:     ipcns,
+		TimeNamespace:    timens,
+		MountNamespace:   mntns,
+		RSeqAddr:         rseqAddr,
+		RSeqSignature:    rseqSignature,
+		ContainerID:      t.ContainerID(),
+		UserCounters:     uc,
+		Personality:      t.Personality(),
 	}
 	if args.Flags&linux.CLONE_THREAD == 0 {
 		cfg.Parent = t
@@ -254,16 +285,14 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		if err := seccheck.Global.SentToSinks(func(c seccheck.Sink) error {
 			return c.Clone(t, mask, info)
 		}); err != nil {
-			// nt has been visible to the rest of the system since NewTask, so
-			// it may be blocking execve or a group stop, have been notified
-			// for group signal delivery, had children reparented to it, etc.
-			// Thus we can't just drop it on the floor. Instead, instruct the
-			// task goroutine to exit immediately, as quietly as possible.
-			nt.exitTracerNotified = true
-			nt.exitTracerAcked = true
-			nt.exitParentNotified = true
-			nt.exitParentAcked = true
-			nt.runState = (*runExitMain)(nil)
+			nt.abortClone()
+			return 0, nil, err
+		}
+	}
+
+	if args.Flags&linux.CLONE_PIDFD != 0 {
+		if err := t.installPIDFD(nt.tg, hostarch.Addr(args.Pidfd)); err != nil {
+			nt.abortClone()
 			return 0, nil, err
 		}
 	}
@@ -272,7 +301,7 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 	// be constrained to the same filters and system call ABI as the parent." -
 	// Documentation/prctl/seccomp_filter.txt
 	if f := t.syscallFilters.Load(); f != nil {
-		copiedFilters := append([]bpf.Program(nil), f.([]bpf.Program)...)
+		copiedFilters := append([]seccompFilter(nil), f.([]seccompFilter)...)
 		nt.syscallFilters.Store(copiedFilters)
 	}
 	if args.Flags&linux.CLONE_VFORK != 0 {
@@ -311,6 +340,45 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 	return ntid, nil, nil
 }
 
+// abortClone is called on a task created by Task.Clone that must not run.
+//
+// nt has been visible to the rest of the system since NewTask, so it may be
+// blocking execve or a group stop, have been notified for group signal
+// delivery, had children reparented to it, etc. Thus we can't just drop it on
+// the floor. Instead, instruct the task goroutine to exit immediately, as
+// quietly as possible.
+//
+// Preconditions: nt's task goroutine hasn't been started.
+func (nt *Task) abortClone() {
+	nt.exitTracerNotified = true
+	nt.exitTracerAcked = true
+	nt.exitParentNotified = true
+	nt.exitParentAcked = true
+	nt.runState = (*runExitMain)(nil)
+}
+
+// installPIDFD installs a pidfd referring to tg in t's FD table, and copies
+// its file descriptor out to addr, as for clone(CLONE_PIDFD).
+func (t *Task) installPIDFD(tg *ThreadGroup, addr hostarch.Addr) error {
+	file, err := NewPIDFD(t, t.k.VFS(), tg, 0)
+	if err != nil {
+		return err
+	}
+	defer file.DecRef(t)
+	// pidfds are always close-on-exec, as in Linux.
+	fd, err := t.NewFDFromVFS2(0, file, FDFlags{CloseOnExec: true})
+	if err != nil {
+		return err
+	}
+	if _, err := primitive.CopyInt32Out(t, addr, fd); err != nil {
+		if _, file := t.fdTable.Remove(t, fd); file != nil {
+			file.DecRef(t)
+		}
+		return err
+	}
+	return nil
+}
+
 func getCloneSeccheckInfo(t, nt *Task, flags uint64) (seccheck.FieldSet, *pb.CloneInfo) {
 	fields := seccheck.Global.GetFieldSet(seccheck.PointClone)
 
@@ -475,6 +543,15 @@ func (t *Task) Unshare(flags int32) error {
 		// new user namespace is used if there is one.
 		t.utsns = t.utsns.Clone(creds.UserNamespace)
 	}
+	if flags&linux.CLONE_NEWTIME != 0 {
+		if !haveCapSysAdmin {
+			t.mu.Unlock()
+			return linuxerr.EPERM
+		}
+		// As in Linux, the caller stays in its time namespace; its
+		// children, and the caller itself after execve, enter the new one.
+		t.timensForChildren = t.timens.NewChild(creds.UserNamespace)
+	}
 	var oldIPCNS *IPCNamespace
 	if flags&linux.CLONE_NEWIPC != 0 {
 		if !haveCapSysAdmin {
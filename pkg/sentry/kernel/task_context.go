@@ -28,8 +28,10 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/sentry/seccheck"
 	"gvisor.dev/gvisor/pkg/sentry/unimpl"
 	"gvisor.dev/gvisor/pkg/sentry/uniqueid"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
 )
@@ -84,6 +86,11 @@ func (t *Task) contextValue(key interface{}, isTaskGoroutine bool) interface{} {
 		return ipcns
 	case CtxTask:
 		return t
+	case CtxRandom:
+		if !isTaskGoroutine {
+			return nil
+		}
+		return t.Random()
 	case auth.CtxCredentials:
 		return t.creds.Load()
 	case auth.CtxThreadGroupID:
@@ -107,6 +114,11 @@ func (t *Task) contextValue(key interface{}, isTaskGoroutine bool) interface{} {
 		}
 		t.mountNamespace.IncRef()
 		return t.mountNamespace
+	case vfs.CtxFDInstaller:
+		if !isTaskGoroutine {
+			return nil
+		}
+		return taskFDInstaller{t}
 	case fs.CtxDirentCacheLimiter:
 		return t.k.DirentCacheLimiter
 	case inet.CtxStack:
@@ -123,8 +135,24 @@ func (t *Task) contextValue(key interface{}, isTaskGoroutine bool) interface{} {
 		return t.k.mf
 	case pgalloc.CtxMemoryFileProvider:
 		return t.k
+	case pgalloc.CtxNUMAPolicy:
+		if !isTaskGoroutine {
+			return nil
+		}
+		// The NUMA policy is only changed by the task goroutine, so it can be
+		// read without locking t.mu.
+		return pgalloc.NUMAPolicy{
+			Policy:    t.numaPolicy,
+			Nodemask:  t.numaNodeMask,
+			LocalNode: t.k.NUMANodeOfCPU(uint(t.CPU())),
+		}
 	case platform.CtxPlatform:
 		return t.k
+	case platform.CtxTSC:
+		if tsc, ok := t.k.timekeeper.VirtualTSC(); ok {
+			return tsc
+		}
+		return nil
 	case uniqueid.CtxGlobalUniqueID:
 		return t.k.UniqueID()
 	case uniqueid.CtxGlobalUniqueIDProvider:
@@ -133,6 +161,13 @@ func (t *Task) contextValue(key interface{}, isTaskGoroutine bool) interface{} {
 		return t.k.GenerateInotifyCookie()
 	case unimpl.CtxEvents:
 		return t.k
+	case seccheck.CtxContainerID:
+		return t.containerID
+	case usage.CtxContainerIO:
+		if t.containerIO == nil {
+			return nil
+		}
+		return t.containerIO
 	case cpuid.CtxFeatureSet:
 		return t.k.featureSet
 	default:
@@ -167,3 +202,26 @@ func (t *Task) AsyncContext() context.Context {
 		fallbackTask: fallbackTask{t},
 	}
 }
+
+// taskFDInstaller implements vfs.FDInstaller for a task's file descriptor
+// table.
+//
+// Preconditions: taskFDInstaller methods must be called on the task goroutine.
+type taskFDInstaller struct {
+	t *Task
+}
+
+// InstallFD implements vfs.FDInstaller.InstallFD.
+func (i taskFDInstaller) InstallFD(ctx context.Context, fd *vfs.FileDescription, closeOnExec bool) (int32, error) {
+	return i.t.NewFDFromVFS2(0, fd, FDFlags{
+		CloseOnExec: closeOnExec,
+	})
+}
+
+// RemoveFD implements vfs.FDInstaller.RemoveFD.
+func (i taskFDInstaller) RemoveFD(ctx context.Context, fdnum int32) {
+	_, file := i.t.fdTable.Remove(ctx, fdnum)
+	if file != nil {
+		file.DecRef(ctx)
+	}
+}
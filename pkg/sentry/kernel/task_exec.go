@@ -213,6 +213,10 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 	t.rseqSignature = 0
 	t.oldRSeqCPUAddr = 0
 	t.tg.oldRSeqCritical.Store(&OldRSeqCriticalRegion{})
+	// Thread and process keyrings are discarded; the session keyring is
+	// preserved. See Linux's kernel/cred.c:prepare_exec_creds().
+	t.threadKeyring = nil
+	t.tg.processKeyring = nil
 	t.tg.pidns.owner.mu.Unlock()
 
 	oldFDTable := t.fdTable
@@ -227,20 +231,27 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 	// Handle the robust futex list.
 	t.exitRobustList()
 
-	// NOTE(b/30815691): We currently do not implement privileged
-	// executables (set-user/group-ID bits and file capabilities). This
-	// allows us to unconditionally enable user dumpability on the new mm.
-	// See fs/exec.c:setup_new_exec.
+	// NOTE(b/30815691): We currently do not implement set-user/group-ID
+	// executables, and file capabilities never grant capabilities that
+	// the task doesn't already have (see Task.updateCredsForExecLocked).
+	// This allows us to unconditionally enable user dumpability on the new
+	// mm. See fs/exec.c:setup_new_exec.
 	r.image.MemoryManager.SetDumpability(mm.UserDumpable)
+	// The core dump filter is preserved across execve(2).
+	r.image.MemoryManager.SetCoreDumpFilter(t.MemoryManager().CoreDumpFilter())
 
 	// Switch to the new process.
 	t.MemoryManager().Deactivate()
 	t.mu.Lock()
 	// Update credentials to reflect the execve. This should precede switching
 	// MMs to ensure that dumpability has been reset first, if needed.
-	t.updateCredsForExecLocked()
+	t.updateCredsForExecLocked(r.image.fileCaps)
 	oldImage := t.image
 	t.image = *r.image
+	// Enter the time namespace created by unshare(CLONE_NEWTIME), if any. The
+	// new image was loaded for it; see Task.Execve.
+	t.timens = t.timensForChildren
+	t.timens.freeze()
 	t.mu.Unlock()
 
 	// Don't hold t.mu while calling t.image.release(), that may
@@ -562,6 +562,9 @@ func (*runExitNotify) execute(t *Task) taskRunState {
 	defer t.tg.pidns.owner.mu.Unlock()
 	t.advanceExitStateLocked(TaskExitInitiated, TaskExitZombie)
 	t.tg.liveTasks--
+	if t.tg.liveTasks == 0 {
+		t.tg.pidfdQueue.Notify(waiter.ReadableEvents)
+	}
 	// Check if this completes a sibling's execve.
 	if t.tg.execing != nil && t.tg.liveTasks == 1 {
 		// execing blocks the addition of new tasks to the thread group, so
@@ -573,6 +576,15 @@ func (*runExitNotify) execute(t *Task) taskRunState {
 		}
 		e.tg.signalHandlers.mu.Unlock()
 	}
+	// Check if this allows a sibling to dump core.
+	if t.tg.coreDumping != nil && t.tg.liveTasks == 1 {
+		c := t.tg.coreDumping
+		c.tg.signalHandlers.mu.Lock()
+		if _, ok := c.stop.(*coreDumpStop); ok {
+			c.endInternalStopLocked()
+		}
+		c.tg.signalHandlers.mu.Unlock()
+	}
 	t.exitNotifyLocked(false)
 	// The task goroutine will now exit.
 	return nil
@@ -712,6 +724,7 @@ func (t *Task) exitNotifyLocked(fromPtraceDetach bool) {
 		} else if tc == 0 {
 			t.tg.pidWithinNS.Store(0)
 			t.tg.processGroup.decRefWithParent(t.tg.parentPG())
+			t.tg.pidfdQueue.Notify(waiter.EventHUp)
 		}
 		if t.parent != nil {
 			delete(t.parent.children, t)
@@ -730,6 +743,9 @@ func (t *Task) exitNotificationSignal(sig linux.Signal, receiver *Task) *linux.S
 	info.SetUID(int32(t.Credentials().RealKUID.In(receiver.UserNamespace()).OrOverflow()))
 	if t.exitStatus.Signaled() {
 		info.Code = linux.CLD_KILLED
+		if t.exitStatus.CoreDumped() {
+			info.Code = linux.CLD_DUMPED
+		}
 		info.SetStatus(int32(t.exitStatus.TerminationSignal()))
 	} else {
 		info.Code = linux.CLD_EXITED
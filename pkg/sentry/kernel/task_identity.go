@@ -217,9 +217,37 @@ func (t *Task) setKUIDsUncheckedLocked(newR, newE, newS auth.KUID) {
 		// Not documented, but compare Linux's kernel/cred.c:commit_creds().
 		t.parentDeathSignal = 0
 	}
+	if oldR != newR {
+		t.setUserCounters(t.k.GetUserCounters(newR), newR != auth.RootKUID)
+	}
 	t.creds.Store(creds)
 }
 
+// setUserCounters moves t's RLIMIT_NPROC accounting to uc, which belongs to
+// t's new real UID. See Linux's kernel/sys.c:set_user() and
+// kernel/cred.c:commit_creds().
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) setUserCounters(uc *userCounters, checkLimit bool) {
+	uc.rlimitNProc.Add(1)
+	t.userCounters.decRLimitNProc()
+	t.userCounters = uc
+	t.nprocExceeded = checkLimit && uc.overRLimitNProc(t)
+}
+
+// CheckRLimitNProcForExec returns EAGAIN if t changed its real UID to a user
+// over RLIMIT_NPROC and the user is still over the limit. It is called at the
+// start of execve. See Linux's fs/exec.c:do_execveat_common().
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) CheckRLimitNProcForExec() error {
+	if t.nprocExceeded && t.userCounters.overRLimitNProc(t) {
+		return linuxerr.EAGAIN
+	}
+	t.nprocExceeded = false
+	return nil
+}
+
 // SetGID implements the semantics of setgid(2).
 func (t *Task) SetGID(gid auth.GID) error {
 	if !gid.Ok() {
@@ -455,19 +483,39 @@ func (t *Task) SetKeepCaps(k bool) {
 	t.creds.Store(creds)
 }
 
-// updateCredsForExecLocked updates t.creds to reflect an execve().
+// RestrictLandlock implements the semantics of landlock_restrict_self(2):
+// it adds layer to the Landlock domain of t's credentials. The domain is
+// inherited by t's children and preserved across execve(2).
+func (t *Task) RestrictLandlock(layer auth.LandlockLayer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	creds := t.Credentials()
+	domain, err := creds.LandlockDomain.Restrict(layer)
+	if err != nil {
+		return err
+	}
+	creds = creds.Fork() // The credentials object is immutable. See doc for creds.
+	creds.LandlockDomain = domain
+	t.creds.Store(creds)
+	return nil
+}
+
+// updateCredsForExecLocked updates t.creds to reflect an execve() of an
+// executable with the given file capabilities, which may be nil.
 //
-// NOTE(b/30815691): We currently do not implement privileged executables
-// (set-user/group-ID bits and file capabilities). This allows us to make a lot
-// of simplifying assumptions:
+// NOTE(b/30815691): We currently do not implement set-user/group-ID
+// executables. This, and the fact that file capabilities can't grant more than
+// the task's permitted capabilities (see below), allows us to make a lot of
+// simplifying assumptions:
 //
 //   - We assume the no_new_privs bit (set by prctl(SET_NO_NEW_PRIVS)), which
 //     disables the features we don't support anyway, is always set. This
 //     drastically simplifies this function.
 //
-//   - We don't set AT_SECURE = 1, because no_new_privs always being set means
-//     that the conditions that require AT_SECURE = 1 never arise. (Compare Linux's
-//     security/commoncap.c:cap_bprm_set_creds() and cap_bprm_secureexec().)
+//   - We only set AT_SECURE = 1 when an unprivileged user executes a file with
+//     the file effective bit set, because no_new_privs always being set means
+//     that the other conditions that require AT_SECURE = 1 never arise. (Compare
+//     Linux's security/commoncap.c:cap_bprm_creds_from_file().)
 //
 //   - We don't check for CAP_SYS_ADMIN in prctl(PR_SET_SECCOMP), since
 //     seccomp-bpf is also allowed if the task has no_new_privs set.
@@ -477,7 +525,7 @@ func (t *Task) SetKeepCaps(k bool) {
 //     unprivileged tracer.
 //
 // Preconditions: t.mu must be locked.
-func (t *Task) updateCredsForExecLocked() {
+func (t *Task) updateCredsForExecLocked(fileCaps *auth.VfsCapData) {
 	// """
 	// During an execve(2), the kernel calculates the new capabilities of
 	// the process using the following algorithm:
@@ -526,11 +574,19 @@ func (t *Task) updateCredsForExecLocked() {
 	// is being executed" also includes the case where (namespace) root is
 	// executing a non-set-user-ID program; the actual check is just based on
 	// the effective user ID.
-	var newPermitted auth.CapabilitySet // since F(inheritable) == F(permitted) == 0
+	var newPermitted auth.CapabilitySet
 	fileEffective := false
 	creds := t.Credentials()
+	if fileCaps != nil {
+		newPermitted = (creds.InheritableCaps & fileCaps.Inheritable) | (fileCaps.Permitted & creds.BoundingCaps)
+		fileEffective = fileCaps.Effective()
+	}
 	root := creds.UserNamespace.MapToKUID(auth.RootUID)
-	if creds.EffectiveKUID == root || creds.RealKUID == root {
+	// If a file with capabilities is executed by a task whose effective, but
+	// not real, user ID is root, only the file capabilities apply. See
+	// Linux's security/commoncap.c:handle_privileged_root().
+	rootOverridden := fileCaps != nil && creds.EffectiveKUID == root && creds.RealKUID != root
+	if !rootOverridden && (creds.EffectiveKUID == root || creds.RealKUID == root) {
 		newPermitted = creds.InheritableCaps | creds.BoundingCaps
 		if creds.EffectiveKUID == root {
 			fileEffective = true
@@ -21,6 +21,7 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/futex"
 	"gvisor.dev/gvisor/pkg/sentry/loader"
 	"gvisor.dev/gvisor/pkg/sentry/mm"
@@ -50,6 +51,11 @@ type TaskImage struct {
 
 	// st is the task's syscall table.
 	st *SyscallTable `state:".(syscallTableInfo)"`
+
+	// fileCaps are the capabilities of the executable file that the image
+	// was loaded from, if any. They are applied to the task's credentials
+	// when it execs into the image.
+	fileCaps *auth.VfsCapData
 }
 
 // release releases all resources held by the TaskImage. release is called by
@@ -141,8 +147,13 @@ func (k *Kernel) LoadTaskImage(ctx context.Context, args loader.LoadArgs) (*Task
 	m := mm.NewMemoryManager(k, k, k.SleepForAddressSpaceActivation)
 	defer m.DecUsers(ctx)
 	args.MemoryManager = m
+	if t := TaskFromContext(ctx); t != nil {
+		// The image is for execve, which enters the task's time namespace
+		// for children.
+		args.DisableVDSOClocks = t.TimeNamespaceForChildren().HasOffsets()
+	}
 
-	os, ac, name, err := loader.Load(ctx, args, k.extraAuxv, k.vdso)
+	os, ac, name, fileCaps, err := loader.Load(ctx, args, k.extraAuxv, k.vdso)
 	if err != nil {
 		return nil, err
 	}
@@ -164,5 +175,6 @@ func (k *Kernel) LoadTaskImage(ctx context.Context, args loader.LoadArgs) (*Task
 		MemoryManager: m,
 		fu:            k.futexes.Fork(),
 		st:            st,
+		fileCaps:      fileCaps,
 	}, nil
 }
@@ -0,0 +1,174 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// Keys returns the keys that t may access.
+func (t *Task) Keys() *auth.KeySet {
+	return t.Credentials().UserNamespace.Keys()
+}
+
+// KeyRequester returns the credentials and keyrings that t performs key
+// operations with.
+func (t *Task) KeyRequester() *auth.KeyRequester {
+	ts := t.k.tasks
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return t.keyRequesterLocked()
+}
+
+// Preconditions: The TaskSet mutex must be locked.
+func (t *Task) keyRequesterLocked() *auth.KeyRequester {
+	creds := t.Credentials()
+	return &auth.KeyRequester{
+		Creds:   creds,
+		Thread:  t.threadKeyring,
+		Process: t.tg.processKeyring,
+		Session: creds.SessionKeyring,
+	}
+}
+
+// LookupKey returns the key with the given serial number, which may be one of
+// linux.KEY_SPEC_*. If create is true, special keyrings that don't exist yet
+// are created. Compare Linux's security/keys/process_keys.c:lookup_user_key().
+func (t *Task) LookupKey(serial auth.KeySerial, create bool) (*auth.Key, error) {
+	if serial > 0 {
+		return t.Keys().Get(serial)
+	}
+
+	keys := t.Keys()
+	ts := t.k.tasks
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	creds := t.Credentials()
+	switch serial {
+	case linux.KEY_SPEC_THREAD_KEYRING:
+		if t.threadKeyring == nil {
+			if !create {
+				return nil, linuxerr.ENOKEY
+			}
+			kr, err := keys.NewKeyring(creds, "_tid")
+			if err != nil {
+				return nil, err
+			}
+			t.threadKeyring = kr
+		}
+		return t.threadKeyring, nil
+
+	case linux.KEY_SPEC_PROCESS_KEYRING:
+		if t.tg.processKeyring == nil {
+			if !create {
+				return nil, linuxerr.ENOKEY
+			}
+			kr, err := keys.NewKeyring(creds, "_pid")
+			if err != nil {
+				return nil, err
+			}
+			t.tg.processKeyring = kr
+		}
+		return t.tg.processKeyring, nil
+
+	case linux.KEY_SPEC_SESSION_KEYRING:
+		if creds.SessionKeyring != nil {
+			return creds.SessionKeyring, nil
+		}
+		if !create {
+			// Tasks without a session keyring implicitly use the user
+			// session keyring.
+			return keys.UserKeyring(creds, true /* session */)
+		}
+		kr, err := keys.JoinSession(t.keyRequesterLocked(), "")
+		if err != nil {
+			return nil, err
+		}
+		t.setSessionKeyringLocked(kr)
+		return kr, nil
+
+	case linux.KEY_SPEC_USER_KEYRING:
+		return keys.UserKeyring(creds, false /* session */)
+
+	case linux.KEY_SPEC_USER_SESSION_KEYRING:
+		return keys.UserKeyring(creds, true /* session */)
+
+	case linux.KEY_SPEC_GROUP_KEYRING:
+		// "Group keyrings ... are not currently implemented" - keyctl(2)
+		return nil, linuxerr.EINVAL
+
+	case linux.KEY_SPEC_REQKEY_AUTH_KEY:
+		// request_key(2) is not supported, so there are never any
+		// authorization keys.
+		return nil, linuxerr.ENOKEY
+
+	default:
+		return nil, linuxerr.EINVAL
+	}
+}
+
+// JoinSessionKeyring implements the semantics of
+// keyctl(KEYCTL_JOIN_SESSION_KEYRING): it subscribes t to a new anonymous
+// session keyring if name is empty, and to the session keyring with the given
+// name otherwise.
+func (t *Task) JoinSessionKeyring(name string) (*auth.Key, error) {
+	ts := t.k.tasks
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	kr, err := t.Keys().JoinSession(t.keyRequesterLocked(), name)
+	if err != nil {
+		return nil, err
+	}
+	t.setSessionKeyringLocked(kr)
+	return kr, nil
+}
+
+// Preconditions: The TaskSet mutex must be locked.
+func (t *Task) setSessionKeyringLocked(kr *auth.Key) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	creds := t.Credentials().Fork() // The credentials object is immutable. See doc for creds.
+	creds.SessionKeyring = kr
+	t.creds.Store(creds)
+}
+
+// CollectKeys removes keys that are no longer reachable from the keyrings of
+// any task in k, releasing the quota that they use.
+func (k *Kernel) CollectKeys() {
+	ts := k.tasks
+	// ts.mu is held throughout so that keyrings can't be installed in tasks
+	// while keys are being collected.
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	// All tasks share the KeySet of the root user namespace.
+	var (
+		keys  *auth.KeySet
+		roots []*auth.Key
+	)
+	ts.forEachTaskLocked(func(t *Task) {
+		creds := t.Credentials()
+		keys = creds.UserNamespace.Keys()
+		for _, kr := range []*auth.Key{t.threadKeyring, t.tg.processKeyring, creds.SessionKeyring} {
+			if kr != nil {
+				roots = append(roots, kr)
+			}
+		}
+	})
+	if keys != nil {
+		keys.Collect(roots)
+	}
+}
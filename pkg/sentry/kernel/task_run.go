@@ -23,7 +23,6 @@ import (
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/goid"
 	"gvisor.dev/gvisor/pkg/hostarch"
-	"gvisor.dev/gvisor/pkg/sentry/hostcpu"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
@@ -57,6 +56,7 @@ type taskRunState interface {
 // searching for Task.run()'s argument value.
 func (t *Task) run(threadID uintptr) {
 	t.goid.Store(goid.Get())
+	t.lockHostThread()
 
 	// Construct t.blockingTimer here. We do this here because we can't
 	// reconstruct t.blockingTimer during restore in Task.afterLoad(), because
@@ -161,6 +161,20 @@ func (app *runApp) execute(t *Task) taskRunState {
 		}
 	}
 
+	// Stay out of application code while our LimitGroup is over its CPU
+	// quota.
+	if lg := t.tg.limitGroup; lg != nil {
+		if d := lg.throttleDelay(t.k); d > 0 {
+			t.k.pressure.cpuThrottleBegin(t.k)
+			_, err := t.BlockWithTimeout(nil, true, d)
+			t.k.pressure.cpuThrottleEnd(t.k)
+			if err == linuxerr.ErrInterrupted {
+				return (*runInterrupt)(nil)
+			}
+			return (*runApp)(nil)
+		}
+	}
+
 	// We're about to switch to the application again. If there's still an
 	// unhandled SyscallRestartErrno that wasn't translated to an EINTR,
 	// restart the syscall that was interrupted. If there's a saved signal
@@ -187,21 +201,28 @@ func (app *runApp) execute(t *Task) taskRunState {
 		}
 	}
 
-	// Apply restartable sequences.
+	// Apply restartable sequences. Tasks using rseq execute application code
+	// on a virtual CPU; acquiring one determines whether the task has been
+	// preempted since it last executed application code.
+	if t.rseqUseCPUs() {
+		if err := t.rseqAcquireCPU(); err != nil {
+			return (*runInterrupt)(nil)
+		}
+	}
 	if t.rseqPreempted {
 		t.rseqPreempted = false
 		if t.rseqAddr != 0 || t.oldRSeqCPUAddr != 0 {
 			// Linux writes the CPU on every preemption. We only do
 			// so if it changed. Thus we may delay delivery of
 			// SIGSEGV if rseqAddr/oldRSeqCPUAddr is invalid.
-			cpu := int32(hostcpu.GetCPU())
-			if t.rseqCPU != cpu {
+			if cpu := t.rseqHeldCPU; t.rseqCPU != cpu {
 				t.rseqCPU = cpu
 				if err := t.rseqCopyOutCPU(); err != nil {
 					t.Debugf("Failed to copy CPU to %#x for rseq: %v", t.rseqAddr, err)
 					t.forceSignal(linux.SIGSEGV, false)
 					t.SendSignal(SignalInfoPriv(linux.SIGSEGV))
 					// Re-enter the task run loop for signal delivery.
+					t.rseqReleaseCPU()
 					return (*runApp)(nil)
 				}
 				if err := t.oldRSeqCopyOutCPU(); err != nil {
@@ -209,6 +230,7 @@ func (app *runApp) execute(t *Task) taskRunState {
 					t.forceSignal(linux.SIGSEGV, false)
 					t.SendSignal(SignalInfoPriv(linux.SIGSEGV))
 					// Re-enter the task run loop for signal delivery.
+					t.rseqReleaseCPU()
 					return (*runApp)(nil)
 				}
 			}
@@ -237,10 +259,16 @@ func (app *runApp) execute(t *Task) taskRunState {
 		t.tg.pidns.owner.mu.RUnlock()
 	}
 
+	if t.k.hostCPUs != nil {
+		t.applyHostCPUAffinity()
+	}
+
 	region := trace.StartRegion(t.traceContext, runRegion)
 	t.accountTaskGoroutineEnter(TaskGoroutineRunningApp)
-	info, at, err := t.p.Switch(t, t.MemoryManager(), t.Arch(), t.rseqCPU)
+	// No platform detects CPU preemption; rseqCPUs does so instead.
+	info, at, err := t.p.Switch(t, t.MemoryManager(), t.Arch(), -1)
 	t.accountTaskGoroutineLeave(TaskGoroutineRunningApp)
+	t.rseqReleaseCPU()
 	region.End()
 
 	if clearSinglestep {
@@ -271,7 +299,9 @@ func (app *runApp) execute(t *Task) taskRunState {
 
 			region := trace.StartRegion(t.traceContext, faultRegion)
 			addr := hostarch.Addr(info.Addr())
+			t.k.pressure.memStallBegin(t.k)
 			err := t.MemoryManager().HandleUserFault(t, addr, at, hostarch.Addr(t.Arch().Stack()))
+			t.k.pressure.memStallEnd(t.k)
 			region.End()
 			if err == nil {
 				// The fault was handled appropriately.
@@ -279,6 +309,13 @@ func (app *runApp) execute(t *Task) taskRunState {
 				return (*runApp)(nil)
 			}
 
+			// If the fault failed because the memory limit was reached,
+			// wait for the OOM killer to free memory and retry.
+			if linuxerr.Equals(linuxerr.ENOMEM, err) && t.k.OOMKillerEnabled() {
+				t.waitForOOM()
+				return (*runApp)(nil)
+			}
+
 			// Is this a vsyscall that we need emulate?
 			//
 			// Note that we don't track vsyscalls as part of a
@@ -338,6 +338,7 @@ func (tg *ThreadGroup) CPUClock() ktime.Clock {
 func (k *Kernel) runCPUClockTicker() {
 	rng := rand.New(rand.NewSource(rand.Int63()))
 	var tgs []*ThreadGroup
+	var lgs []*LimitGroup
 
 	for {
 		// Stop the CPU clock while nothing is running.
@@ -371,6 +372,14 @@ func (k *Kernel) runCPUClockTicker() {
 		// Check thread group CPU timers.
 		tgs = k.tasks.Root.ThreadGroupsAppend(tgs)
 		for _, tg := range tgs {
+			if lg := tg.limitGroup; lg != nil {
+				k.tasks.mu.RLock()
+				if lg.chargeLocked(k, tg, now) {
+					lgs = append(lgs, lg)
+				}
+				k.tasks.mu.RUnlock()
+			}
+
 			if tg.cpuTimersEnabled.Load() == 0 {
 				continue
 			}
@@ -452,6 +461,21 @@ func (k *Kernel) runCPUClockTicker() {
 
 		k.cpuClockMu.Unlock()
 
+		// Enforce timeslices of tasks holding virtual CPUs for rseq.
+		k.rseqCPUs.tick(now)
+
+		// Observe whether tasks are waiting for CPU, and attribute pressure
+		// stall time at (at least) CPU clock tick granularity.
+		k.pressure.update(k)
+
+		// Check memory limits once per period, without holding CPU clock
+		// locks.
+		for i, lg := range lgs {
+			lg.enforceMemoryLimit(k)
+			lgs[i] = nil
+		}
+		lgs = lgs[:0]
+
 		// Retain tgs between calls to Notify to reduce allocations.
 		for i := range tgs {
 			tgs[i] = nil
@@ -576,12 +600,12 @@ func (t *Task) CPUMask() sched.CPUSet {
 // Preconditions: mask.Size() ==
 // sched.CPUSetSize(t.Kernel().ApplicationCores()).
 func (t *Task) SetCPUMask(mask sched.CPUSet) error {
-	if want := sched.CPUSetSize(t.k.applicationCores); mask.Size() != want {
+	if want := sched.CPUSetSize(t.k.ApplicationCores()); mask.Size() != want {
 		panic(fmt.Sprintf("Invalid CPUSet %v (expected %d bytes)", mask, want))
 	}
 
 	// Remove CPUs in mask above Kernel.applicationCores.
-	mask.ClearAbove(t.k.applicationCores)
+	mask.ClearAbove(t.k.ApplicationCores())
 
 	// Ensure that at least 1 CPU is still allowed.
 	if mask.NumCPUs() == 0 {
@@ -601,14 +625,39 @@ func (t *Task) SetCPUMask(mask sched.CPUSet) error {
 	defer t.mu.Unlock()
 	t.allowedCPUMask = mask
 	t.cpu.Store(assignCPU(mask, rootTID))
+	t.hostAffinityApplied.Store(0)
 	return nil
 }
 
+// resizeCPUMask returns a copy of mask, which was created for oldCores CPUs,
+// resized for newCores CPUs.
+func resizeCPUMask(mask sched.CPUSet, oldCores, newCores uint) sched.CPUSet {
+	if mask.NumCPUs() >= oldCores {
+		return sched.NewFullCPUSet(newCores)
+	}
+	resized := sched.NewCPUSet(newCores)
+	mask.ForEachCPU(func(cpu uint) {
+		if cpu < newCores {
+			resized.Set(cpu)
+		}
+	})
+	if resized.NumCPUs() == 0 {
+		return sched.NewFullCPUSet(newCores)
+	}
+	return resized
+}
+
 // CPU returns the cpu id for a given task.
 func (t *Task) CPU() int32 {
 	if t.k.useHostCores {
 		return int32(hostcpu.GetCPU())
 	}
+	if t.k.hostCPUs != nil {
+		if cpu := t.hostCPU(); cpu >= 0 {
+			t.cpu.Store(cpu)
+			return cpu
+		}
+	}
 
 	return t.cpu.Load()
 }
@@ -204,6 +204,10 @@ func (t *Task) deliverSignal(info *linux.SignalInfo, act linux.SigAction) taskRu
 
 		eventchannel.Emit(ucs)
 
+		if sigact == SignalActionCore {
+			t.logFatalSignal(info)
+			return t.groupExitWithCoreDump(info)
+		}
 		t.PrepareGroupExit(linux.WaitStatusTerminationSignal(sig))
 		return (*runExit)(nil)
 
@@ -234,6 +238,24 @@ func (t *Task) deliverSignal(info *linux.SignalInfo, act linux.SigAction) taskRu
 	return (*runInterrupt)(nil)
 }
 
+// logFatalSignal logs a description of the fault that caused the fatal
+// signal described by info, if any, to assist in debugging application
+// crashes.
+func (t *Task) logFatalSignal(info *linux.SignalInfo) {
+	switch linux.Signal(info.Signo) {
+	case linux.SIGSEGV, linux.SIGBUS, linux.SIGILL, linux.SIGFPE, linux.SIGTRAP:
+	default:
+		return
+	}
+	m := t.MemoryManager()
+	if m == nil {
+		return
+	}
+	addr := hostarch.Addr(info.Addr())
+	ip := hostarch.Addr(t.Arch().IP())
+	t.Infof("Fatal signal %d (code %d): fault address %#x (%s), ip %#x (%s), sp %#x", info.Signo, info.Code, addr, m.DescribeAddr(t, addr), ip, m.DescribeAddr(t, ip), t.Arch().Stack())
+}
+
 // deliverSignalToHandler changes the task's userspace state to enter the given
 // user-configured handler for the given signal.
 func (t *Task) deliverSignalToHandler(info *linux.SignalInfo, act linux.SigAction) error {
@@ -82,8 +82,9 @@ type TaskConfig struct {
 	// IPCNamespace is the IPCNamespace of the new task.
 	IPCNamespace *IPCNamespace
 
-	// AbstractSocketNamespace is the AbstractSocketNamespace of the new task.
-	AbstractSocketNamespace *AbstractSocketNamespace
+	// TimeNamespace is the TimeNamespace of the new task. If nil, the
+	// kernel's root time namespace is used.
+	TimeNamespace *TimeNamespace
 
 	// MountNamespace is the MountNamespace of the new task.
 	MountNamespace *vfs.MountNamespace
@@ -100,6 +101,9 @@ type TaskConfig struct {
 
 	// UserCounters is user resource counters.
 	UserCounters *userCounters
+
+	// Personality is the personality of the new task.
+	Personality uint32
 }
 
 // NewTask creates a new task defined by cfg.
@@ -145,30 +149,39 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 			parent:   cfg.Parent,
 			children: make(map[*Task]struct{}),
 		},
-		runState:        (*runApp)(nil),
-		interruptChan:   make(chan struct{}, 1),
-		signalMask:      atomicbitops.FromUint64(uint64(cfg.SignalMask)),
-		signalStack:     linux.SignalStack{Flags: linux.SS_DISABLE},
-		image:           *image,
-		fsContext:       cfg.FSContext,
-		fdTable:         cfg.FDTable,
-		k:               cfg.Kernel,
-		ptraceTracees:   make(map[*Task]struct{}),
-		allowedCPUMask:  cfg.AllowedCPUMask.Copy(),
-		ioUsage:         &usage.IO{},
-		niceness:        cfg.Niceness,
-		utsns:           cfg.UTSNamespace,
-		ipcns:           cfg.IPCNamespace,
-		abstractSockets: cfg.AbstractSocketNamespace,
-		mountNamespace:  cfg.MountNamespace,
-		rseqCPU:         -1,
-		rseqAddr:        cfg.RSeqAddr,
-		rseqSignature:   cfg.RSeqSignature,
-		futexWaiter:     futex.NewWaiter(),
-		containerID:     cfg.ContainerID,
-		cgroups:         make(map[Cgroup]struct{}),
-		userCounters:    cfg.UserCounters,
+		runState:       (*runApp)(nil),
+		interruptChan:  make(chan struct{}, 1),
+		signalMask:     atomicbitops.FromUint64(uint64(cfg.SignalMask)),
+		signalStack:    linux.SignalStack{Flags: linux.SS_DISABLE},
+		image:          *image,
+		fsContext:      cfg.FSContext,
+		fdTable:        cfg.FDTable,
+		k:              cfg.Kernel,
+		ptraceTracees:  make(map[*Task]struct{}),
+		allowedCPUMask: cfg.AllowedCPUMask.Copy(),
+		ioUsage:        &usage.IO{},
+		niceness:       cfg.Niceness,
+		utsns:          cfg.UTSNamespace,
+		ipcns:          cfg.IPCNamespace,
+		mountNamespace: cfg.MountNamespace,
+		rseqCPU:        -1,
+		rseqHeldCPU:    -1,
+		rseqAddr:       cfg.RSeqAddr,
+		rseqSignature:  cfg.RSeqSignature,
+		futexWaiter:    futex.NewWaiter(),
+		containerID:    cfg.ContainerID,
+		cgroups:        make(map[Cgroup]struct{}),
+		userCounters:   cfg.UserCounters,
+		personality:    atomicbitops.FromUint32(cfg.Personality),
+	}
+	if cfg.ContainerID != "" {
+		t.containerIO = cfg.Kernel.ContainerIO(cfg.ContainerID)
+	}
+	if t.timens = cfg.TimeNamespace; t.timens == nil {
+		t.timens = cfg.Kernel.rootTimeNamespace
 	}
+	t.timens.freeze()
+	t.timensForChildren = t.timens
 	t.netns.Store(cfg.NetworkNamespace)
 	t.creds.Store(cfg.Credentials)
 	t.endStopCond.L = &t.tg.signalHandlers.mu
@@ -258,8 +271,19 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 	tg.liveTasks++
 	tg.activeTasks++
 
-	// Propagate external TaskSet stops to the new task.
-	t.stopCount = atomicbitops.FromInt32(ts.stopCount)
+	// If tg is stopping or stopped, t joins the group stop, so that a
+	// thread cloned while a group stop is in progress doesn't escape it. This
+	// is analogous to Linux's kernel/signal.c:task_join_group_stop().
+	if tg.groupStopPendingCount != 0 {
+		t.groupStopPending = true
+		tg.groupStopPendingCount++
+	} else if tg.groupStopComplete {
+		t.groupStopPending = true
+		t.groupStopAcknowledged = true
+	}
+
+	// Propagate external TaskSet and container stops to the new task.
+	t.stopCount = atomicbitops.FromInt32(ts.stopCount + ts.containerStopCount[t.containerID])
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -206,6 +206,62 @@ func (ts *TaskSet) BeginExternalStop() {
 	}
 }
 
+// BeginContainerExternalStop indicates the start of an external stop that
+// applies to all current and future tasks in ts that belong to the container
+// with the given ID. It returns the tasks that were stopped.
+// BeginContainerExternalStop does not wait for task goroutines to stop.
+func (ts *TaskSet) BeginContainerExternalStop(cid string) []*Task {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.containerStopCount == nil {
+		ts.containerStopCount = make(map[string]int32)
+	}
+	ts.containerStopCount[cid]++
+	if ts.containerStopCount[cid] <= 0 {
+		panic(fmt.Sprintf("Invalid stopCount for container %q: %d", cid, ts.containerStopCount[cid]))
+	}
+	if ts.Root == nil {
+		return nil
+	}
+	var stopped []*Task
+	for t := range ts.Root.tids {
+		if t.containerID != cid {
+			continue
+		}
+		t.tg.signalHandlers.mu.Lock()
+		t.beginStopLocked()
+		t.tg.signalHandlers.mu.Unlock()
+		t.interrupt()
+		stopped = append(stopped, t)
+	}
+	return stopped
+}
+
+// EndContainerExternalStop indicates the end of an external stop started by a
+// previous call to TaskSet.BeginContainerExternalStop for the same container.
+// EndContainerExternalStop does not wait for task goroutines to resume.
+func (ts *TaskSet) EndContainerExternalStop(cid string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.containerStopCount[cid]--
+	if n := ts.containerStopCount[cid]; n < 0 {
+		panic(fmt.Sprintf("Invalid stopCount for container %q: %d", cid, n))
+	} else if n == 0 {
+		delete(ts.containerStopCount, cid)
+	}
+	if ts.Root == nil {
+		return
+	}
+	for t := range ts.Root.tids {
+		if t.containerID != cid {
+			continue
+		}
+		t.tg.signalHandlers.mu.Lock()
+		t.endStopLocked()
+		t.tg.signalHandlers.mu.Unlock()
+	}
+}
+
 // PullFullState receives full states for all tasks.
 func (ts *TaskSet) PullFullState() {
 	ts.mu.Lock()
@@ -143,7 +143,9 @@ type ThreadGroup struct {
 	// exitStatus is the thread group's exit status.
 	//
 	// While exiting is false, exitStatus is protected by the signal mutex.
-	// When exiting becomes true, exitStatus becomes immutable.
+	// When exiting becomes true, exitStatus becomes immutable, except that a
+	// task that dumps core after all other tasks in the thread group have
+	// exited sets its core dump flag.
 	exitStatus linux.WaitStatus
 
 	// terminationSignal is the signal that this thread group's leader will
@@ -226,6 +228,12 @@ type ThreadGroup struct {
 	// Resource limits for this ThreadGroup. The limits pointer is immutable.
 	limits *limits.LimitSet
 
+	// limitGroup is the LimitGroup that this thread group belongs to. If nil,
+	// the thread group isn't a member of any LimitGroup.
+	//
+	// limitGroup is immutable after the thread group's first task is created.
+	limitGroup *LimitGroup
+
 	// processGroup is the processGroup for this thread group.
 	//
 	// processGroup is protected by the TaskSet mutex.
@@ -238,6 +246,12 @@ type ThreadGroup struct {
 	// execed is protected by the TaskSet mutex.
 	execed bool
 
+	// processKeyring is the thread group's process keyring, or nil if it has
+	// none. See process-keyring(7).
+	//
+	// processKeyring is protected by the TaskSet mutex.
+	processKeyring *auth.Key
+
 	// oldRSeqCritical is the thread group's old rseq critical region.
 	oldRSeqCritical atomic.Value `state:".(*OldRSeqCriticalRegion)"`
 
@@ -76,6 +76,15 @@ type TaskSet struct {
 	// always reset to zero after restore.
 	stopCount int32 `state:"nosave"`
 
+	// containerStopCount maps container IDs to the number of active external
+	// stops applicable to all tasks in the container (calls to
+	// TaskSet.BeginContainerExternalStop that have not been paired with a call
+	// to TaskSet.EndContainerExternalStop). containerStopCount is protected
+	// by mu.
+	//
+	// containerStopCount is not saved for the same reason as stopCount.
+	containerStopCount map[string]int32 `state:"nosave"`
+
 	// liveGoroutines is the number of non-exited task goroutines in the
 	// TaskSet.
 	//
@@ -306,6 +315,16 @@ func (ns *PIDNamespace) UserNamespace() *auth.UserNamespace {
 	return ns.userns
 }
 
+// IsAncestorOf returns true if ns is other or one of its ancestors.
+func (ns *PIDNamespace) IsAncestorOf(other *PIDNamespace) bool {
+	for ; other != nil; other = other.parent {
+		if other == ns {
+			return true
+		}
+	}
+	return false
+}
+
 // Root returns the root PID namespace of ns.
 func (ns *PIDNamespace) Root() *PIDNamespace {
 	return ns.owner.Root
@@ -336,6 +355,11 @@ type threadGroupNode struct {
 	// thread group. Events are defined in task_exit.go.
 	eventQueue waiter.Queue
 
+	// pidfdQueue is notified when the readiness of pidfds referring to this
+	// thread group changes, i.e. when all of its tasks have exited and when
+	// it is reaped.
+	pidfdQueue waiter.Queue
+
 	// leader is the thread group's leader, which is the oldest task in the
 	// thread group; usually the last task in the thread group to call
 	// execve(), or if no such task exists then the first task in the thread
@@ -359,6 +383,14 @@ type threadGroupNode struct {
 	// execing is protected by the TaskSet mutex.
 	execing *Task
 
+	// If coreDumping is not nil, it is a task in the thread group that has
+	// killed all other tasks so that it can dump core once they have exited.
+	//
+	// coreDumping is analogous to Linux's mm_struct::core_state.
+	//
+	// coreDumping is protected by the TaskSet mutex.
+	coreDumping *Task
+
 	// tasks is all tasks in the thread group that have not yet been reaped.
 	//
 	// tasks is protected by both the TaskSet mutex and the signal mutex:
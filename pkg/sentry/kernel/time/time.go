@@ -246,6 +246,19 @@ type Clock interface {
 	waiter.Waitable
 }
 
+// TimerTracker is implemented by Clocks that don't elapse on their own, and so
+// need to know when their Timers next expire in order to drive them, by
+// calling Timer.Tick.
+type TimerTracker interface {
+	// TrackTimer is called whenever Timer t, using the Clock, is set to next
+	// check for expirations at next, or with enabled false when t stops
+	// checking for expirations.
+	//
+	// TrackTimer is called with t's mutex locked, so it must not call any
+	// method of t nor take any locks that precede Timer.mu in lock order.
+	TrackTimer(t *Timer, next Time, enabled bool)
+}
+
 // WallRateClock implements Clock.WallTimeUntil for Clocks that elapse at the
 // same rate as wall time.
 type WallRateClock struct{}
@@ -494,6 +507,7 @@ func (t *Timer) Destroy() {
 	// t.kicker.Reset, before calling t.kicker.Stop.
 	t.mu.Lock()
 	t.setting.Enabled = false
+	t.untrackLocked()
 	t.mu.Unlock()
 	t.kicker.Stop()
 	// Unregister t.entry, ensuring that the Clock will not send to t.events,
@@ -542,6 +556,7 @@ func (t *Timer) Pause() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.paused = true
+	t.untrackLocked()
 	// t.kicker may be nil if we were restored but never resumed.
 	if t.kicker != nil {
 		t.kicker.Stop()
@@ -662,6 +677,19 @@ func (t *Timer) resetKickerLocked(now Time) {
 	// which case t.kicker has already fired and t.kicker.Stop will be an
 	// expensive no-op (time.Timer.Stop => time.stopTimer => runtime.stopTimer
 	// => runtime.deltimer).
+	if tr, ok := t.clock.(TimerTracker); ok {
+		tr.TrackTimer(t, t.setting.Next, t.setting.Enabled)
+	}
+}
+
+// untrackLocked tells t.clock, if it is a TimerTracker, that t no longer
+// checks for expirations.
+//
+// Preconditions: t.mu must be locked.
+func (t *Timer) untrackLocked() {
+	if tr, ok := t.clock.(TimerTracker); ok {
+		tr.TrackTimer(t, Time{}, false)
+	}
 }
 
 // Clock returns the Clock used by t.
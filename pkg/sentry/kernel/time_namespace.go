@@ -0,0 +1,214 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// TimeNamespace represents a time namespace, which holds offsets applied to
+// CLOCK_MONOTONIC and CLOCK_BOOTTIME for the tasks in it. See
+// time_namespaces(7).
+//
+// +stateify savable
+type TimeNamespace struct {
+	// userns is the user namespace associated with the TimeNamespace.
+	// Changing the offsets requires CAP_SYS_TIME in userns.
+	//
+	// userns is immutable.
+	userns *auth.UserNamespace
+
+	// base is the clock that the offsets are applied to.
+	//
+	// base is immutable.
+	base ktime.Clock
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// monotonicOffset and boottimeOffset are the offsets added to
+	// CLOCK_MONOTONIC and CLOCK_BOOTTIME respectively.
+	monotonicOffset time.Duration
+	boottimeOffset  time.Duration
+
+	// frozen is true once a task has entered the namespace. The offsets
+	// can't be changed after that.
+	frozen bool
+
+	// monotonicClock and boottimeClock are the clocks seen by tasks in the
+	// namespace. They are set when the namespace is frozen, and are
+	// immutable thereafter.
+	monotonicClock ktime.Clock
+	boottimeClock  ktime.Clock
+}
+
+// NewRootTimeNamespace returns a time namespace with no offsets from base,
+// which may be entered directly.
+func NewRootTimeNamespace(base ktime.Clock, userns *auth.UserNamespace) *TimeNamespace {
+	ns := &TimeNamespace{
+		userns: userns,
+		base:   base,
+	}
+	ns.freeze()
+	return ns
+}
+
+// NewChild returns a new, unfrozen time namespace owned by userns, with
+// offsets copied from ns.
+func (ns *TimeNamespace) NewChild(userns *auth.UserNamespace) *TimeNamespace {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return &TimeNamespace{
+		userns:          userns,
+		base:            ns.base,
+		monotonicOffset: ns.monotonicOffset,
+		boottimeOffset:  ns.boottimeOffset,
+	}
+}
+
+// UserNamespace returns the user namespace associated with this time
+// namespace.
+func (ns *TimeNamespace) UserNamespace() *auth.UserNamespace {
+	return ns.userns
+}
+
+// Offsets returns the offsets of CLOCK_MONOTONIC and CLOCK_BOOTTIME in ns.
+func (ns *TimeNamespace) Offsets() (monotonic, boottime time.Duration) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.monotonicOffset, ns.boottimeOffset
+}
+
+// SetOffsets sets the offsets of CLOCK_MONOTONIC and CLOCK_BOOTTIME in ns on
+// behalf of creds.
+func (ns *TimeNamespace) SetOffsets(creds *auth.Credentials, monotonic, boottime time.Duration) error {
+	// Compare Linux's kernel/time/namespace.c:proc_timens_set_offset().
+	if !creds.HasCapabilityIn(linux.CAP_SYS_TIME, ns.userns) {
+		return linuxerr.EPERM
+	}
+	now := ns.base.Now()
+	for _, offset := range []time.Duration{monotonic, boottime} {
+		if t := now.Add(offset); t.Before(ktime.ZeroTime) || t.Nanoseconds() > math.MaxInt64/2 {
+			return linuxerr.ERANGE
+		}
+	}
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.frozen {
+		return linuxerr.EACCES
+	}
+	ns.monotonicOffset = monotonic
+	ns.boottimeOffset = boottime
+	return nil
+}
+
+// HasOffsets returns true if either offset in ns is non-zero.
+func (ns *TimeNamespace) HasOffsets() bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.monotonicOffset != 0 || ns.boottimeOffset != 0
+}
+
+// freeze prevents further changes to the offsets in ns. It must be called
+// before any task enters ns.
+func (ns *TimeNamespace) freeze() {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if ns.frozen {
+		return
+	}
+	ns.frozen = true
+	ns.monotonicClock = newOffsetClock(ns.base, ns.monotonicOffset)
+	ns.boottimeClock = newOffsetClock(ns.base, ns.boottimeOffset)
+}
+
+// MonotonicClock returns the CLOCK_MONOTONIC seen by tasks in ns.
+//
+// Preconditions: A task has entered ns.
+func (ns *TimeNamespace) MonotonicClock() ktime.Clock {
+	return ns.monotonicClock
+}
+
+// BoottimeClock returns the CLOCK_BOOTTIME seen by tasks in ns.
+//
+// Preconditions: A task has entered ns.
+func (ns *TimeNamespace) BoottimeClock() ktime.Clock {
+	return ns.boottimeClock
+}
+
+// TimeNamespace returns the task's time namespace.
+func (t *Task) TimeNamespace() *TimeNamespace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timens
+}
+
+// TimeNamespaceForChildren returns the time namespace that will be entered by
+// the task's children, and by the task itself on its next execve.
+func (t *Task) TimeNamespaceForChildren() *TimeNamespace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timensForChildren
+}
+
+// offsetClock is a ktime.Clock that is offset from another Clock by a
+// constant amount.
+//
+// +stateify savable
+type offsetClock struct {
+	base   ktime.Clock
+	offset time.Duration
+}
+
+// newOffsetClock returns a clock that is offset from base by offset.
+func newOffsetClock(base ktime.Clock, offset time.Duration) ktime.Clock {
+	if offset == 0 {
+		return base
+	}
+	return &offsetClock{base: base, offset: offset}
+}
+
+// Now implements ktime.Clock.Now.
+func (c *offsetClock) Now() ktime.Time {
+	return c.base.Now().Add(c.offset)
+}
+
+// WallTimeUntil implements ktime.Clock.WallTimeUntil.
+func (c *offsetClock) WallTimeUntil(t, now ktime.Time) time.Duration {
+	return c.base.WallTimeUntil(t.Add(-c.offset), now.Add(-c.offset))
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (c *offsetClock) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return c.base.Readiness(mask)
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (c *offsetClock) EventRegister(e *waiter.Entry) error {
+	return c.base.EventRegister(e)
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (c *offsetClock) EventUnregister(e *waiter.Entry) {
+	c.base.EventUnregister(e)
+}
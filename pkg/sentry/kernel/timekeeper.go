@@ -16,6 +16,7 @@ package kernel
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/atomicbitops"
@@ -59,6 +60,11 @@ type Timekeeper struct {
 	// monotonicLowerBound is the lowerBound for monotonic time.
 	monotonicLowerBound atomicbitops.Int64 `state:"nosave"`
 
+	// realtimeOffset is the offset, in nanoseconds, to apply to the realtime
+	// clock output from clocks. It allows the sandbox's CLOCK_REALTIME to be
+	// set without changing the host's; see SetRealtimeOffset.
+	realtimeOffset atomicbitops.Int64
+
 	// restored, if non-nil, indicates that this Timekeeper was restored
 	// from a state file. The clocks are not set until restored is closed.
 	restored chan struct{} `state:"nosave"`
@@ -83,6 +89,14 @@ type Timekeeper struct {
 	// params manages the parameter page.
 	params *VDSOParamPage
 
+	// paramsMu serializes writes to params, and protects lastParams.
+	paramsMu sync.Mutex `state:"nosave"`
+
+	// lastParams are the parameters most recently computed by the update
+	// goroutine, before realtimeOffset is applied. They are used to rewrite
+	// params immediately when realtimeOffset changes.
+	lastParams vdsoParams `state:"nosave"`
+
 	// mu protects destruction with stop and wg.
 	mu sync.Mutex `state:"nosave"`
 
@@ -91,6 +105,31 @@ type Timekeeper struct {
 
 	// wg is used to indicate that the update goroutine has exited.
 	wg sync.WaitGroup `state:"nosave"`
+
+	// virtual is clocks if they are virtual, i.e. if time only advances when
+	// explicitly told to; see AdvanceTime. Otherwise it is nil.
+	//
+	// It is set only once, by SetClocks.
+	virtual *sentrytime.VirtualClocks `state:"nosave"`
+
+	// virtualQuantum is the number of nanoseconds by which virtual time
+	// advances every time the application reads it; see AdvanceQuantum.
+	virtualQuantum atomicbitops.Int64 `state:"nosave"`
+
+	// virtualMu protects virtualTimers and virtualTimerSeq. It is locked with
+	// ktime.Timer.mu held, so it must not be held while calling Timer
+	// methods.
+	virtualMu sync.Mutex `state:"nosave"`
+
+	// virtualTimers are the enabled Timers using the realtime and monotonic
+	// clocks while time is virtual. Since virtual time doesn't elapse on its
+	// own, these Timers are ticked by AdvanceTime instead of by their own
+	// goroutines.
+	virtualTimers map[*ktime.Timer]virtualTimer `state:"nosave"`
+
+	// virtualTimerSeq is the sequence number of the last update to
+	// virtualTimers.
+	virtualTimerSeq uint64 `state:"nosave"`
 }
 
 // NewTimekeeper returns a Timekeeper that is automatically kept up-to-date.
@@ -117,9 +156,13 @@ func (t *Timekeeper) SetClocks(c sentrytime.Clocks) {
 	// Update the params, marking them "not ready", as we may need to
 	// restart calibration on this new machine.
 	if t.restored != nil {
-		if err := t.params.Write(func() vdsoParams {
+		t.paramsMu.Lock()
+		t.lastParams = vdsoParams{}
+		err := t.params.Write(func() vdsoParams {
 			return vdsoParams{}
-		}); err != nil {
+		})
+		t.paramsMu.Unlock()
+		if err != nil {
 			panic("unable to reset VDSO params: " + err.Error())
 		}
 	}
@@ -129,6 +172,15 @@ func (t *Timekeeper) SetClocks(c sentrytime.Clocks) {
 	}
 
 	t.clocks = c
+	if vc, ok := c.(*sentrytime.VirtualClocks); ok {
+		t.virtual = vc
+		t.virtualTimers = make(map[*ktime.Timer]virtualTimer)
+		if t.restored != nil {
+			// Resume virtual time where it was saved: no time elapses
+			// while it isn't being advanced.
+			vc.Reset(t.saveMonotonic, t.saveRealtime)
+		}
+	}
 
 	// Compute the offset of the monotonic clock from the base Clocks.
 	//
@@ -199,8 +251,11 @@ func (t *Timekeeper) NowMonotonic() tcpip.MonotonicTime {
 }
 
 // AfterFunc implements tcpip.Clock.
+//
+// The timer is based on the monotonic clock, so that it isn't affected by
+// changes to the realtime clock.
 func (t *Timekeeper) AfterFunc(d time.Duration, f func()) tcpip.Timer {
-	return ktime.AfterFunc(t.realtimeClock, d, f)
+	return ktime.AfterFunc(t.monotonicClock, d, f)
 }
 
 // startUpdater starts an update goroutine that keeps the clocks updated.
@@ -230,7 +285,8 @@ func (t *Timekeeper) startUpdater() {
 			// Call Update within a Write block to prevent the VDSO
 			// from using the old params between Update and
 			// Write.
-			if err := t.params.Write(func() vdsoParams {
+			t.paramsMu.Lock()
+			err := t.params.Write(func() vdsoParams {
 				monotonicParams, monotonicOk, realtimeParams, realtimeOk := t.clocks.Update()
 
 				var p vdsoParams
@@ -246,8 +302,11 @@ func (t *Timekeeper) startUpdater() {
 					p.realtimeBaseRef = int64(realtimeParams.BaseRef)
 					p.realtimeFrequency = realtimeParams.Frequency
 				}
-				return p
-			}); err != nil {
+				t.lastParams = p
+				return t.offsetParams(p)
+			})
+			t.paramsMu.Unlock()
+			if err != nil {
 				log.Warningf("Unable to update VDSO parameter page: %v", err)
 			}
 
@@ -260,6 +319,14 @@ func (t *Timekeeper) startUpdater() {
 	}()
 }
 
+// offsetParams returns p with realtimeOffset applied.
+func (t *Timekeeper) offsetParams(p vdsoParams) vdsoParams {
+	if p.realtimeReady != 0 {
+		p.realtimeBaseRef += t.realtimeOffset.Load()
+	}
+	return p
+}
+
 // stopUpdater stops the update goroutine, blocking until it exits.
 //
 // mu must be held.
@@ -306,6 +373,9 @@ func (t *Timekeeper) GetTime(c sentrytime.ClockID) (int64, error) {
 		<-t.restored
 	}
 	now, err := t.clocks.GetTime(c)
+	if err == nil && c == sentrytime.Realtime {
+		now += t.realtimeOffset.Load()
+	}
 	if err == nil && c == sentrytime.Monotonic {
 		now += t.monotonicOffset
 		for {
@@ -328,8 +398,49 @@ func (t *Timekeeper) GetTime(c sentrytime.ClockID) (int64, error) {
 }
 
 // BootTime returns the system boot real time.
+//
+// Like in Linux, the boot time moves with changes to the realtime clock.
 func (t *Timekeeper) BootTime() ktime.Time {
-	return t.bootTime
+	return t.bootTime.Add(time.Duration(t.realtimeOffset.Load()))
+}
+
+// RealtimeOffset returns the offset of the sandbox's realtime clock from the
+// host's.
+func (t *Timekeeper) RealtimeOffset() time.Duration {
+	return time.Duration(t.realtimeOffset.Load())
+}
+
+// SetRealtimeOffset sets the offset of the sandbox's realtime clock from the
+// host's. The host's clock is not affected.
+//
+// Timers based on the realtime clock are notified of the change, so absolute
+// deadlines are reevaluated against the new time.
+func (t *Timekeeper) SetRealtimeOffset(offset time.Duration) {
+	t.paramsMu.Lock()
+	t.realtimeOffset.Store(int64(offset))
+	if t.lastParams.realtimeReady != 0 {
+		// Don't let the VDSO use the old offset until the next update.
+		p := t.offsetParams(t.lastParams)
+		if err := t.params.Write(func() vdsoParams {
+			return p
+		}); err != nil {
+			log.Warningf("Unable to update VDSO parameter page: %v", err)
+		}
+	}
+	t.paramsMu.Unlock()
+	t.realtimeClock.Notify(ktime.ClockEventSet)
+}
+
+// SetRealtime sets the sandbox's realtime clock to now, by adjusting its
+// offset from the host's.
+func (t *Timekeeper) SetRealtime(now ktime.Time) error {
+	host, err := t.GetTime(sentrytime.Realtime)
+	if err != nil {
+		return err
+	}
+	host -= t.realtimeOffset.Load()
+	t.SetRealtimeOffset(time.Duration(now.Nanoseconds() - host))
+	return nil
 }
 
 // timekeeperClock is a ktime.Clock that reads time from a
@@ -340,12 +451,10 @@ type timekeeperClock struct {
 	tk *Timekeeper
 	c  sentrytime.ClockID
 
-	// Implements ktime.Clock.WallTimeUntil.
-	ktime.WallRateClock `state:"nosave"`
-
-	// Implements waiter.Waitable. (We have no ability to detect
-	// discontinuities from external changes to CLOCK_REALTIME).
-	ktime.NoClockEvents `state:"nosave"`
+	// Implements waiter.Waitable. ClockEventSet is notified when the
+	// sandbox's realtime clock is set. (We have no ability to detect
+	// discontinuities from external changes to the host's CLOCK_REALTIME).
+	ktime.ClockEventsQueue `state:"nosave"`
 }
 
 // Now implements ktime.Clock.Now.
@@ -356,3 +465,18 @@ func (tc *timekeeperClock) Now() ktime.Time {
 	}
 	return ktime.FromNanoseconds(now)
 }
+
+// WallTimeUntil implements ktime.Clock.WallTimeUntil.
+func (tc *timekeeperClock) WallTimeUntil(t, now ktime.Time) time.Duration {
+	if tc.tk.virtual != nil {
+		// Virtual time doesn't elapse on its own, so Timers must wait for
+		// AdvanceTime to tick them.
+		return time.Duration(math.MaxInt64)
+	}
+	return t.Sub(now)
+}
+
+// TrackTimer implements ktime.TimerTracker.TrackTimer.
+func (tc *timekeeperClock) TrackTimer(timer *ktime.Timer, next ktime.Time, enabled bool) {
+	tc.tk.trackTimer(tc.c, timer, next, enabled)
+}
@@ -33,6 +33,9 @@ func (t *Timekeeper) beforeSave() {
 	if t.saveRealtime, err = t.GetTime(time.Realtime); err != nil {
 		panic("unable to get current realtime: " + err.Error())
 	}
+	// saveRealtime is compared against the host's realtime clock after
+	// restore, while realtimeOffset is saved separately.
+	t.saveRealtime -= t.realtimeOffset.Load()
 }
 
 // afterLoad is invoked by stateify.
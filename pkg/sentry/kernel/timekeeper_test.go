@@ -16,13 +16,16 @@ package kernel
 
 import (
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	sentrytime "gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 // mockClocks is a sentrytime.Clocks that simply returns the times in the
@@ -58,9 +61,12 @@ func stateTestClocklessTimekeeper(tb testing.TB) *Timekeeper {
 	if err != nil {
 		tb.Fatalf("failed to allocate memory: %v", err)
 	}
-	return &Timekeeper{
+	tk := &Timekeeper{
 		params: NewVDSOParamPage(mfp, fr),
 	}
+	tk.realtimeClock = &timekeeperClock{tk: tk, c: sentrytime.Realtime}
+	tk.monotonicClock = &timekeeperClock{tk: tk, c: sentrytime.Monotonic}
+	return tk
 }
 
 func stateTestTimekeeper(tb testing.TB) *Timekeeper {
@@ -154,3 +160,44 @@ func TestTimekeeperMonotonicJumpBackwards(t *testing.T) {
 		t.Errorf("GetTime got %d want 100000", now)
 	}
 }
+
+// TestTimekeeperRealtimeOffset tests that setting the realtime clock only
+// offsets the sandbox's realtime, and notifies timers.
+func TestTimekeeperRealtimeOffset(t *testing.T) {
+	c := &mockClocks{
+		monotonic: 100000,
+		realtime:  500000,
+	}
+
+	tk := stateTestClocklessTimekeeper(t)
+	tk.SetClocks(c)
+	defer tk.Destroy()
+
+	e, ch := waiter.NewChannelEntry(ktime.ClockEventSet)
+	tk.realtimeClock.EventRegister(&e)
+	defer tk.realtimeClock.EventUnregister(&e)
+
+	if err := tk.SetRealtime(ktime.FromNanoseconds(42)); err != nil {
+		t.Fatalf("SetRealtime failed: %v", err)
+	}
+	select {
+	case <-ch:
+	default:
+		t.Errorf("SetRealtime didn't notify ClockEventSet")
+	}
+	if got, want := tk.RealtimeOffset(), time.Duration(42-500000); got != want {
+		t.Errorf("RealtimeOffset got %v want %v", got, want)
+	}
+
+	c.realtime += 10
+	c.monotonic += 10
+	if now, err := tk.GetTime(sentrytime.Realtime); err != nil || now != 52 {
+		t.Errorf("GetTime(Realtime) got (%d, %v) want (52, nil)", now, err)
+	}
+	if now, err := tk.GetTime(sentrytime.Monotonic); err != nil || now != 10 {
+		t.Errorf("GetTime(Monotonic) got (%d, %v) want (10, nil)", now, err)
+	}
+	if got, want := tk.BootTime(), ktime.FromNanoseconds(42); got != want {
+		t.Errorf("BootTime got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	sentrytime "gvisor.dev/gvisor/pkg/sentry/time"
+)
+
+// ErrNotVirtualTime is returned by operations that require virtual time when
+// the Timekeeper's clocks are not virtual.
+var ErrNotVirtualTime = errors.New("virtual time is not enabled")
+
+// virtualTimer is the state of a Timer tracked by a Timekeeper keeping virtual
+// time.
+type virtualTimer struct {
+	// clock is the clock used by the Timer.
+	clock sentrytime.ClockID
+
+	// next is the time, according to clock, at which the Timer next checks
+	// for expirations.
+	next ktime.Time
+
+	// seq orders Timers with the same deadline, in the order in which they
+	// were set.
+	seq uint64
+}
+
+// IsVirtual returns true if t keeps virtual time, i.e. if its clocks only
+// advance when explicitly told to.
+func (t *Timekeeper) IsVirtual() bool {
+	return t.virtual != nil
+}
+
+// SetVirtualTimeQuantum sets the amount by which virtual time advances every
+// time the application reads it. A zero quantum means that time only advances
+// with AdvanceTime and AdvanceToNextTimer.
+func (t *Timekeeper) SetVirtualTimeQuantum(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	t.virtualQuantum.Store(int64(d))
+}
+
+// trackTimer implements ktime.TimerTracker.TrackTimer for the Timers of t's
+// clock c.
+//
+// Preconditions: timer.mu must be locked.
+func (t *Timekeeper) trackTimer(c sentrytime.ClockID, timer *ktime.Timer, next ktime.Time, enabled bool) {
+	if t.virtual == nil {
+		return
+	}
+	t.virtualMu.Lock()
+	defer t.virtualMu.Unlock()
+	if !enabled {
+		delete(t.virtualTimers, timer)
+		return
+	}
+	t.virtualTimerSeq++
+	t.virtualTimers[timer] = virtualTimer{
+		clock: c,
+		next:  next,
+		seq:   t.virtualTimerSeq,
+	}
+}
+
+// virtualNow returns the current monotonic time, and the offset of the
+// realtime clock from it, in nanoseconds.
+func (t *Timekeeper) virtualNow() (int64, int64) {
+	mono, err := t.GetTime(sentrytime.Monotonic)
+	if err != nil {
+		panic(fmt.Sprintf("timekeeper.GetTime(sentrytime.Monotonic): %v", err))
+	}
+	rt, err := t.GetTime(sentrytime.Realtime)
+	if err != nil {
+		panic(fmt.Sprintf("timekeeper.GetTime(sentrytime.Realtime): %v", err))
+	}
+	return mono, rt - mono
+}
+
+// monotonicDeadline returns the monotonic time at which vt next checks for
+// expirations, given the offset of the realtime clock from the monotonic
+// clock.
+func (vt *virtualTimer) monotonicDeadline(realOffset int64) int64 {
+	if vt.clock == sentrytime.Realtime {
+		return vt.next.Nanoseconds() - realOffset
+	}
+	return vt.next.Nanoseconds()
+}
+
+// nextVirtualTimer returns the tracked Timer with the earliest deadline and
+// its deadline on the monotonic clock. If remove is true and the deadline is
+// no later than now, the Timer is no longer tracked.
+func (t *Timekeeper) nextVirtualTimer(now, realOffset int64, remove bool) (*ktime.Timer, int64) {
+	t.virtualMu.Lock()
+	defer t.virtualMu.Unlock()
+	var (
+		next     *ktime.Timer
+		nextVT   virtualTimer
+		deadline int64
+	)
+	for timer, vt := range t.virtualTimers {
+		d := vt.monotonicDeadline(realOffset)
+		if next == nil || d < deadline || (d == deadline && vt.seq < nextVT.seq) {
+			next, nextVT, deadline = timer, vt, d
+		}
+	}
+	if next != nil && remove && deadline <= now {
+		delete(t.virtualTimers, next)
+	}
+	return next, deadline
+}
+
+// fireVirtualTimers ticks all Timers whose deadlines have passed, in deadline
+// order.
+func (t *Timekeeper) fireVirtualTimers() {
+	for {
+		now, realOffset := t.virtualNow()
+		timer, deadline := t.nextVirtualTimer(now, realOffset, true /* remove */)
+		if timer == nil || deadline > now {
+			return
+		}
+		// Tick tracks the Timer again if it has a later deadline.
+		timer.Tick()
+	}
+}
+
+// AdvanceTime advances virtual time by d, firing every Timer that expires in
+// the meantime, and returns the new monotonic time.
+func (t *Timekeeper) AdvanceTime(d time.Duration) (ktime.Time, error) {
+	if t.virtual == nil {
+		return ktime.Time{}, ErrNotVirtualTime
+	}
+	t.virtual.Advance(int64(d))
+	t.fireVirtualTimers()
+	now, _ := t.virtualNow()
+	return ktime.FromNanoseconds(now), nil
+}
+
+// AdvanceToNextTimer advances virtual time to the earliest Timer deadline,
+// firing the Timers that expire then, and returns the new monotonic time. If
+// no Timer is set, time doesn't advance and ok is false.
+func (t *Timekeeper) AdvanceToNextTimer() (now ktime.Time, ok bool, err error) {
+	if t.virtual == nil {
+		return ktime.Time{}, false, ErrNotVirtualTime
+	}
+	mono, realOffset := t.virtualNow()
+	timer, deadline := t.nextVirtualTimer(mono, realOffset, false /* remove */)
+	if timer != nil {
+		t.virtual.Advance(deadline - mono)
+		t.fireVirtualTimers()
+	}
+	mono, _ = t.virtualNow()
+	return ktime.FromNanoseconds(mono), timer != nil, nil
+}
+
+// AdvanceQuantum advances virtual time by the quantum set by
+// SetVirtualTimeQuantum. It is called whenever the application reads the time,
+// so that busy loops waiting for time to pass make progress.
+func (t *Timekeeper) AdvanceQuantum() {
+	if t.virtual == nil {
+		return
+	}
+	if q := t.virtualQuantum.Load(); q > 0 {
+		t.virtual.Advance(q)
+		t.fireVirtualTimers()
+	}
+}
+
+// VirtualTSC returns the value of the virtual TSC, which counts virtual
+// monotonic nanoseconds, advancing time by the quantum first. ok is false if
+// t's time isn't virtual.
+func (t *Timekeeper) VirtualTSC() (tsc uint64, ok bool) {
+	if t.virtual == nil {
+		return 0, false
+	}
+	t.AdvanceQuantum()
+	now, _ := t.virtualNow()
+	return uint64(now), true
+}
+
+// IsIdle returns true if no task can make progress until a timer expires or an
+// external event occurs, i.e. if no task goroutine is running or blocked
+// uninterruptibly.
+func (k *Kernel) IsIdle() bool {
+	if k.runningTasks.Load() != 0 {
+		return false
+	}
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	for t := range k.tasks.Root.tids {
+		if t.TaskGoroutineSchedInfo().State == TaskGoroutineBlockedUninterruptible {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitIdle blocks until the kernel has been idle, per IsIdle, for at least
+// settle. It returns an error if timeout elapses first; a zero timeout waits
+// forever.
+//
+// Time here is host time: it is used to let tasks run between virtual time
+// advances, and doesn't affect virtual time.
+func (k *Kernel) WaitIdle(settle, timeout time.Duration) error {
+	start := time.Now()
+	var idleSince time.Time
+	for {
+		now := time.Now()
+		if !k.IsIdle() {
+			idleSince = time.Time{}
+		} else if idleSince.IsZero() {
+			idleSince = now
+		} else if now.Sub(idleSince) >= settle {
+			return nil
+		}
+		if timeout > 0 && now.Sub(start) >= timeout {
+			return fmt.Errorf("sandbox not idle after %v", timeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
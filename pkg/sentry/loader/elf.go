@@ -128,7 +128,13 @@ func parseHeader(ctx context.Context, f fullReader) (elfInfo, error) {
 
 	// We only support 64-bit, little endian binaries
 	if class := elf.Class(ident[elf.EI_CLASS]); class != elf.ELFCLASS64 {
-		log.Infof("Unsupported ELF class: %v", class)
+		if class == elf.ELFCLASS32 {
+			// There is no compat (e.g. ia32) syscall table, so 32-bit
+			// binaries can't run even with the PER_LINUX32 personality.
+			ctx.Warningf("32-bit ELF binaries are not supported")
+		} else {
+			log.Infof("Unsupported ELF class: %v", class)
+		}
 		return elfInfo{}, linuxerr.ENOEXEC
 	}
 	if endian := elf.Data(ident[elf.EI_DATA]); endian != elf.ELFDATA2LSB {
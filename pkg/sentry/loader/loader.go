@@ -83,6 +83,11 @@ type LoadArgs struct {
 
 	// Features specifies the CPU feature set for the executable.
 	Features cpuid.FeatureSet
+
+	// DisableVDSOClocks causes the VDSO's clock functions to always fall
+	// back to system calls. This is required in time namespaces with clock
+	// offsets, since the VDSO param page reflects the root time namespace.
+	DisableVDSOClocks bool
 }
 
 // openPath opens args.Filename and checks that it is valid for loading.
@@ -221,27 +226,86 @@ func loadExecutable(ctx context.Context, args LoadArgs) (loadedELF, *arch.Contex
 	return loadedELF{}, nil, nil, nil, linuxerr.ELOOP
 }
 
+// fileCapabilities returns the capabilities of file that apply to the calling
+// task, or nil if there are none. This is analogous to Linux's
+// security/commoncap.c:get_file_caps().
+func fileCapabilities(ctx context.Context, file fsbridge.File) (*auth.VfsCapData, error) {
+	if f, ok := file.(*fsbridge.VFSFile); ok && f.FileDescription().Mount().Flags().NoSUID {
+		return nil, nil
+	}
+	data, err := file.GetXattr(ctx, linux.XATTR_NAME_CAPS)
+	if err != nil {
+		if linuxerr.Equals(linuxerr.ENODATA, err) || linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	caps, err := auth.VfsCapDataOf(data)
+	if err != nil {
+		return nil, err
+	}
+	// File capabilities that were set in a user namespace that doesn't own
+	// the caller's are ignored.
+	if !caps.OwnedBy(auth.CredentialsFromContext(ctx).UserNamespace) {
+		return nil, nil
+	}
+	return &caps, nil
+}
+
+// atSecure returns the value of the AT_SECURE auxiliary vector entry.
+func atSecure(secure bool) hostarch.Addr {
+	if secure {
+		return 1
+	}
+	return 0
+}
+
 // Load loads args.File into a MemoryManager. If args.File is nil, the path
 // args.Filename is resolved and loaded instead.
 //
 // If Load returns ErrSwitchFile it should be called again with the returned
 // path and argv.
 //
+// Load also returns the capabilities of the loaded file, if any, which should
+// be applied to the credentials of the task executing it.
+//
 // Preconditions:
 //   - The Task MemoryManager is empty.
 //   - Load is called on the Task goroutine.
-func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *VDSO) (abi.OS, *arch.Context64, string, *syserr.Error) {
+func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *VDSO) (abi.OS, *arch.Context64, string, *auth.VfsCapData, *syserr.Error) {
 	// Load the executable itself.
 	loaded, ac, file, newArgv, err := loadExecutable(ctx, args)
 	if err != nil {
-		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("failed to load %s: %v", args.Filename, err), syserr.FromError(err).ToLinux())
+		return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("failed to load %s: %v", args.Filename, err), syserr.FromError(err).ToLinux())
 	}
 	defer file.DecRef(ctx)
 
+	c := auth.CredentialsFromContext(ctx)
+
+	// Read the capabilities of the loaded file, which is the interpreter
+	// rather than the script in the case of interpreter scripts.
+	fileCaps, err := fileCapabilities(ctx, file)
+	if err != nil {
+		return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("failed to read file capabilities of %s: %v", args.Filename, err), syserr.FromError(err).ToLinux())
+	}
+	secure := false
+	if fileCaps != nil && fileCaps.Effective() {
+		// If the file effective bit is set, the file permitted set must be
+		// granted in full for the executable to work correctly. See Linux's
+		// security/commoncap.c:bprm_caps_from_vfs_caps().
+		if newPermitted := (fileCaps.Permitted & c.BoundingCaps) | (fileCaps.Inheritable & c.InheritableCaps); fileCaps.Permitted&^newPermitted != 0 {
+			return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("file capabilities of %s exceed the capability bounding set", args.Filename), errno.EPERM)
+		}
+		// Executables that gain capabilities run in secure-execution mode
+		// unless the real UID is root; compare Linux's
+		// security/commoncap.c:cap_bprm_creds_from_file().
+		secure = c.RealKUID != c.UserNamespace.MapToKUID(auth.RootUID)
+	}
+
 	// Load the VDSO.
-	vdsoAddr, err := loadVDSO(ctx, args.MemoryManager, vdso, loaded)
+	vdsoAddr, err := loadVDSO(ctx, args.MemoryManager, vdso, loaded, args.DisableVDSOClocks)
 	if err != nil {
-		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("error loading VDSO: %v", err), syserr.FromError(err).ToLinux())
+		return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("error loading VDSO: %v", err), syserr.FromError(err).ToLinux())
 	}
 
 	// Setup the heap. brk starts at the next page after the end of the
@@ -249,43 +313,42 @@ func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *V
 	// loaded.end is available for its use.
 	e, ok := loaded.end.RoundUp()
 	if !ok {
-		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("brk overflows: %#x", loaded.end), errno.ENOEXEC)
+		return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("brk overflows: %#x", loaded.end), errno.ENOEXEC)
 	}
 	args.MemoryManager.BrkSetup(ctx, e)
 
 	// Allocate our stack.
 	stack, err := allocStack(ctx, args.MemoryManager, ac)
 	if err != nil {
-		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("Failed to allocate stack: %v", err), syserr.FromError(err).ToLinux())
+		return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("Failed to allocate stack: %v", err), syserr.FromError(err).ToLinux())
 	}
 
 	// Push the original filename to the stack, for AT_EXECFN.
 	if _, err := stack.PushNullTerminatedByteSlice([]byte(args.Filename)); err != nil {
-		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("Failed to push exec filename: %v", err), syserr.FromError(err).ToLinux())
+		return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("Failed to push exec filename: %v", err), syserr.FromError(err).ToLinux())
 	}
 	execfn := stack.Bottom
 
 	// Push 16 random bytes on the stack which AT_RANDOM will point to.
 	var b [16]byte
 	if _, err := rand.Read(b[:]); err != nil {
-		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("Failed to read random bytes: %v", err), syserr.FromError(err).ToLinux())
+		return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("Failed to read random bytes: %v", err), syserr.FromError(err).ToLinux())
 	}
 	if _, err = stack.PushNullTerminatedByteSlice(b[:]); err != nil {
-		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("Failed to push random bytes: %v", err), syserr.FromError(err).ToLinux())
+		return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("Failed to push random bytes: %v", err), syserr.FromError(err).ToLinux())
 	}
 	random := stack.Bottom
 
-	c := auth.CredentialsFromContext(ctx)
-
 	// Add generic auxv entries.
 	auxv := append(loaded.auxv, arch.Auxv{
 		arch.AuxEntry{linux.AT_UID, hostarch.Addr(c.RealKUID.In(c.UserNamespace).OrOverflow())},
 		arch.AuxEntry{linux.AT_EUID, hostarch.Addr(c.EffectiveKUID.In(c.UserNamespace).OrOverflow())},
 		arch.AuxEntry{linux.AT_GID, hostarch.Addr(c.RealKGID.In(c.UserNamespace).OrOverflow())},
 		arch.AuxEntry{linux.AT_EGID, hostarch.Addr(c.EffectiveKGID.In(c.UserNamespace).OrOverflow())},
-		// The conditions that require AT_SECURE = 1 never arise. See
-		// kernel.Task.updateCredsForExecLocked.
-		arch.AuxEntry{linux.AT_SECURE, 0},
+		// Setting the set-user-ID and set-group-ID bits is not
+		// implemented, so AT_SECURE = 1 is only required by file
+		// capabilities. See kernel.Task.updateCredsForExecLocked.
+		arch.AuxEntry{linux.AT_SECURE, atSecure(secure)},
 		arch.AuxEntry{linux.AT_CLKTCK, linux.CLOCKS_PER_SEC},
 		arch.AuxEntry{linux.AT_EXECFN, execfn},
 		arch.AuxEntry{linux.AT_RANDOM, random},
@@ -296,7 +359,7 @@ func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *V
 
 	sl, err := stack.Load(newArgv, args.Envv, auxv)
 	if err != nil {
-		return 0, nil, "", syserr.NewDynamic(fmt.Sprintf("Failed to load stack: %v", err), syserr.FromError(err).ToLinux())
+		return 0, nil, "", nil, syserr.NewDynamic(fmt.Sprintf("Failed to load stack: %v", err), syserr.FromError(err).ToLinux())
 	}
 
 	m := args.MemoryManager
@@ -316,5 +379,5 @@ func Load(ctx context.Context, args LoadArgs, extraAuxv []arch.AuxEntry, vdso *V
 		name = name[:linux.TASK_COMM_LEN-1]
 	}
 
-	return loaded.os, ac, name, nil
+	return loaded.os, ac, name, fileCaps, nil
 }
@@ -163,6 +163,11 @@ type VDSO struct {
 	// inform the VDSO for timekeeping data.
 	ParamPage *mm.SpecialMappable
 
+	// disabledParamPage is a parameter page that is never updated, so the
+	// VDSO's clock functions always fall back to system calls. It is mapped
+	// instead of ParamPage if LoadArgs.DisableVDSOClocks is set.
+	disabledParamPage *mm.SpecialMappable
+
 	// vdso is the VDSO ELF itself.
 	vdso *mm.SpecialMappable
 
@@ -218,9 +223,16 @@ func PrepareVDSO(mfp pgalloc.MemoryFileProvider) (*VDSO, error) {
 		mf.DecRef(vdso)
 		return nil, fmt.Errorf("unable to allocate VDSO param page: %v", err)
 	}
+	disabledParamPage, err := mf.Allocate(hostarch.PageSize, pgalloc.AllocOpts{Kind: usage.System})
+	if err != nil {
+		mf.DecRef(vdso)
+		mf.DecRef(paramPage)
+		return nil, fmt.Errorf("unable to allocate VDSO param page: %v", err)
+	}
 
 	return &VDSO{
-		ParamPage: mm.NewSpecialMappable("[vvar]", mfp, paramPage),
+		ParamPage:         mm.NewSpecialMappable("[vvar]", mfp, paramPage),
+		disabledParamPage: mm.NewSpecialMappable("[vvar]", mfp, disabledParamPage),
 		// TODO(gvisor.dev/issue/157): Don't advertise the VDSO, as
 		// some applications may not be able to handle multiple [vdso]
 		// hints.
@@ -231,6 +243,40 @@ func PrepareVDSO(mfp pgalloc.MemoryFileProvider) (*VDSO, error) {
 	}, nil
 }
 
+// mapParamPage maps the param page at addr in m.
+func (v *VDSO) mapParamPage(ctx context.Context, m *mm.MemoryManager, addr hostarch.Addr, disableClocks bool) error {
+	paramPage := v.ParamPage
+	if disableClocks {
+		paramPage = v.disabledParamPage
+	}
+	_, err := m.MMap(ctx, memmap.MMapOpts{
+		Length:          paramPage.Length(),
+		MappingIdentity: paramPage,
+		Mappable:        paramPage,
+		Addr:            addr,
+		Fixed:           true,
+		Unmap:           true,
+		Private:         true,
+		Perms:           hostarch.Read,
+		MaxPerms:        hostarch.Read,
+	})
+	return err
+}
+
+// RemapVDSOParamPage replaces the VDSO param page mapped into m by Load, as
+// if Load had been called with the given value of LoadArgs.DisableVDSOClocks.
+// It is used when a forked task enters a time namespace that requires a
+// different param page than its parent's.
+func RemapVDSOParamPage(ctx context.Context, m *mm.MemoryManager, v *VDSO, disableClocks bool) error {
+	sigreturn := m.VDSOSigReturn()
+	if sigreturn == 0 {
+		// No VDSO is mapped.
+		return nil
+	}
+	vdsoAddr := hostarch.Addr(sigreturn - vdsoSigreturnOffset + vdsoPrelink)
+	return v.mapParamPage(ctx, m, vdsoAddr-hostarch.Addr(v.ParamPage.Length()), disableClocks)
+}
+
 // loadVDSO loads the VDSO into m.
 //
 // VDSOs are special.
@@ -245,7 +291,7 @@ func PrepareVDSO(mfp pgalloc.MemoryFileProvider) (*VDSO, error) {
 // compatibility with such binaries, we load the VDSO much like Linux.
 //
 // loadVDSO takes a reference on the VDSO and parameter page FrameRegions.
-func loadVDSO(ctx context.Context, m *mm.MemoryManager, v *VDSO, bin loadedELF) (hostarch.Addr, error) {
+func loadVDSO(ctx context.Context, m *mm.MemoryManager, v *VDSO, bin loadedELF, disableClocks bool) (hostarch.Addr, error) {
 	if v.os != bin.os {
 		ctx.Warningf("Binary ELF OS %v and VDSO ELF OS %v differ", bin.os, v.os)
 		return 0, linuxerr.ENOEXEC
@@ -268,18 +314,7 @@ func loadVDSO(ctx context.Context, m *mm.MemoryManager, v *VDSO, bin loadedELF)
 	}
 
 	// Now map the param page.
-	_, err = m.MMap(ctx, memmap.MMapOpts{
-		Length:          v.ParamPage.Length(),
-		MappingIdentity: v.ParamPage,
-		Mappable:        v.ParamPage,
-		Addr:            addr,
-		Fixed:           true,
-		Unmap:           true,
-		Private:         true,
-		Perms:           hostarch.Read,
-		MaxPerms:        hostarch.Read,
-	})
-	if err != nil {
+	if err := v.mapParamPage(ctx, m, addr, disableClocks); err != nil {
 		ctx.Infof("Unable to map VDSO param page: %v", err)
 		return 0, err
 	}
@@ -100,6 +100,43 @@ type Mappable interface {
 	InvalidateUnsavable(ctx context.Context) error
 }
 
+// CacheStat is the state of the cache for a range of a Mappable, as reported
+// by cachestat(2). All fields are numbers of pages.
+type CacheStat struct {
+	// Cache is the number of cached pages.
+	Cache uint64
+
+	// Dirty is the number of cached pages that haven't been written back.
+	Dirty uint64
+
+	// Writeback is the number of cached pages that are being written back.
+	Writeback uint64
+
+	// Evicted is the number of pages that were evicted from the cache and
+	// haven't been cached again since.
+	Evicted uint64
+
+	// RecentlyEvicted is the number of evicted pages that were in active use
+	// when they were evicted.
+	RecentlyEvicted uint64
+}
+
+// CachedMappable is an optional interface implemented by Mappables that cache
+// file contents in sentry memory, so that cachestat(2), mincore(2) and
+// preadv2(RWF_NOWAIT) agree on which pages are cached.
+//
+// Both methods have the precondition that mr is page-aligned.
+type CachedMappable interface {
+	Mappable
+
+	// CacheStat returns the state of the cache for offsets mr.
+	CacheStat(mr MappableRange) CacheStat
+
+	// CachedRanges calls fn, in order, with each maximal subrange of mr that
+	// is cached. fn must not call into the Mappable.
+	CachedRanges(mr MappableRange, fn func(MappableRange))
+}
+
 // Translations are returned by Mappable.Translate.
 type Translation struct {
 	// Source is the translated range in the Mappable.
@@ -380,6 +417,14 @@ type MMapOpts struct {
 	// underlying memory backing the mapping thus the memory content is
 	// guaranteed not to be modified outside the sentry's purview.
 	SentryOwnedContent bool
+
+	// Secret indicates that the mapping's memory may only be accessed by the
+	// application through the mapping itself, as for memfd_secret(2). I/O
+	// performed by the sentry on the mapped range (e.g. for read(2),
+	// ptrace(PTRACE_PEEKDATA) or process_vm_readv(2)) fails.
+	//
+	// If Secret is true, Private must be false.
+	Secret bool
 }
 
 // File represents a host file that may be mapped into an platform.AddressSpace.
@@ -16,9 +16,11 @@ package mm
 
 import (
 	"fmt"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 )
 
@@ -147,6 +149,7 @@ func (mm *MemoryManager) Deactivate() {
 		mm.activeMu.Unlock()
 		return
 	}
+	mm.lastActive.Store(time.Now().UnixNano())
 
 	// Can we hold on to the address space?
 	if !mm.p.CooperativelySchedulesAddressSpace() {
@@ -175,9 +178,12 @@ func (mm *MemoryManager) mapASLocked(pseg pmaIterator, ar hostarch.AddrRange, pr
 	// By default, map entire pmas at a time, under the assumption that there
 	// is no cost to mapping more of a pma than necessary.
 	mapAR := hostarch.AddrRange{0, ^hostarch.Addr(hostarch.PageSize - 1)}
-	if precommit {
+	mf := mm.mfp.MemoryFile()
+	lazy := mf.LazyLoading()
+	if precommit || lazy {
 		// When explicitly precommitting, only map ar, since overmapping may
-		// incur unexpected resource usage.
+		// incur unexpected resource usage. When the MemoryFile is still
+		// being loaded, overmapping would load pages that may never be used.
 		mapAR = ar
 	} else if mapUnit := mm.p.MapUnit(); mapUnit != 0 {
 		// Limit the range we map to ar, aligned to mapUnit.
@@ -205,7 +211,15 @@ func (mm *MemoryManager) mapASLocked(pseg pmaIterator, ar hostarch.AddrRange, pr
 			perms.Write = false
 		}
 		if perms.Any() { // MapFile precondition
-			if err := mm.as.MapFile(pmaMapAR.Start, pma.file, pseg.fileRangeOf(pmaMapAR), perms, precommit); err != nil {
+			fr := pseg.fileRangeOf(pmaMapAR)
+			// Pages mapped into the AddressSpace are accessed without
+			// MemoryFile.MapInternal, so they must be loaded first.
+			if lazy && pma.file == memmap.File(mf) {
+				if err := mf.EnsureLoaded(fr); err != nil {
+					return err
+				}
+			}
+			if err := mm.as.MapFile(pmaMapAR.Start, pma.file, fr, perms, precommit); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,118 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// CoreDumpSegment describes a vma in a core dump.
+type CoreDumpSegment struct {
+	// Start and End are the bounds of the vma.
+	Start hostarch.Addr
+	End   hostarch.Addr
+
+	// Perms is the vma's permissions.
+	Perms hostarch.AccessType
+
+	// DumpSize is the number of bytes, starting at Start, whose contents are
+	// included in the core dump.
+	DumpSize uint64
+}
+
+// CoreDumpSegments returns the segments that a core dump of mm should
+// contain, as selected by mm's core dump filter. Compare Linux's
+// fs/coredump.c:vma_dump_size().
+func (mm *MemoryManager) CoreDumpSegments() []CoreDumpSegment {
+	filter := mm.CoreDumpFilter()
+
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	var segs []CoreDumpSegment
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		seg := CoreDumpSegment{
+			Start: vseg.Start(),
+			End:   vseg.End(),
+			Perms: vma.realPerms,
+		}
+		whole := uint64(vseg.Range().Length())
+		_, special := vma.mappable.(*SpecialMappable)
+		anon := vma.mappable == nil || special
+		switch {
+		case vma.secret:
+			// The contents of secret memory are never dumped.
+		case !vma.private && anon:
+			if filter&linux.MMF_DUMP_ANON_SHARED != 0 {
+				seg.DumpSize = whole
+			}
+		case !vma.private:
+			if filter&linux.MMF_DUMP_MAPPED_SHARED != 0 {
+				seg.DumpSize = whole
+			}
+		case anon:
+			if filter&linux.MMF_DUMP_ANON_PRIVATE != 0 {
+				seg.DumpSize = whole
+			}
+		case filter&linux.MMF_DUMP_MAPPED_PRIVATE != 0:
+			seg.DumpSize = whole
+		case vma.realPerms.Write && filter&linux.MMF_DUMP_ANON_PRIVATE != 0:
+			// Writable private file mappings, e.g. data segments, may
+			// contain anonymous copy-on-write pages. Unlike Linux, we don't
+			// track whether this is actually the case.
+			seg.DumpSize = whole
+		case vma.off == 0 && filter&linux.MMF_DUMP_ELF_HEADERS != 0:
+			// Dump the first page of file mappings that may contain ELF
+			// headers, which allows debuggers to identify mapped binaries
+			// by their build ID.
+			seg.DumpSize = hostarch.PageSize
+		}
+		segs = append(segs, seg)
+	}
+	return segs
+}
+
+// ReadCoreDumpPage reads the page at addr, which must be page-aligned, into
+// dst, which must be hostarch.PageSize bytes long. It returns false, without
+// reading the page, if the page has never been faulted in or can't be read;
+// such pages are omitted from core dumps, rather than being faulted in and
+// allocating memory.
+func (mm *MemoryManager) ReadCoreDumpPage(ctx context.Context, addr hostarch.Addr, dst []byte) bool {
+	mm.activeMu.RLock()
+	present := mm.pmas.FindSegment(addr).Ok()
+	mm.activeMu.RUnlock()
+	if !present {
+		return false
+	}
+	_, err := mm.CopyIn(ctx, addr, dst, usermem.IOOpts{IgnorePermissions: true})
+	return err == nil
+}
+
+// DescribeAddr returns a description of the vma containing addr, in the
+// format of /proc/[pid]/maps, for use in diagnostics.
+func (mm *MemoryManager) DescribeAddr(ctx context.Context, addr hostarch.Addr) string {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	vseg := mm.vmas.FindSegment(addr)
+	if !vseg.Ok() {
+		return "unmapped"
+	}
+	return strings.TrimSuffix(string(mm.vmaMapsEntryLocked(ctx, vseg)), "\n")
+}
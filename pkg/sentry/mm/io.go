@@ -536,6 +536,14 @@ func (mm *MemoryManager) withInternalMappings(ctx context.Context, ar hostarch.A
 		}
 		ar.End = vendaddr
 	}
+	if end, err := mm.nonSecretEndLocked(vseg, ar, ignorePermissions); end < ar.End {
+		if end <= ar.Start {
+			mm.mappingMu.RUnlock()
+			return 0, err
+		}
+		ar.End = end
+		verr = err
+	}
 
 	// Ensure that we have usable pmas.
 	mm.activeMu.Lock()
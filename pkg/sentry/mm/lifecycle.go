@@ -17,6 +17,7 @@ package mm
 import (
 	"fmt"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
@@ -29,7 +30,7 @@ import (
 
 // NewMemoryManager returns a new MemoryManager with no mappings and 1 user.
 func NewMemoryManager(p platform.Platform, mfp pgalloc.MemoryFileProvider, sleepForActivation bool) *MemoryManager {
-	return &MemoryManager{
+	mm := &MemoryManager{
 		p:                  p,
 		mfp:                mfp,
 		haveASIO:           p.SupportsAddressSpaceIO(),
@@ -37,9 +38,12 @@ func NewMemoryManager(p platform.Platform, mfp pgalloc.MemoryFileProvider, sleep
 		users:              atomicbitops.FromInt32(1),
 		auxv:               arch.Auxv{},
 		dumpability:        atomicbitops.FromInt32(int32(UserDumpable)),
+		coreDumpFilter:     atomicbitops.FromUint32(linux.MMF_DUMP_FILTER_DEFAULT),
 		aioManager:         aioManager{contexts: make(map[uint64]*AIOContext)},
 		sleepForActivation: sleepForActivation,
 	}
+	mfp.MemoryFile().MarkSwappable(mm)
+	return mm
 }
 
 // SetMmapLayout initializes mm's layout from the given arch.Context64.
@@ -93,6 +97,7 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		// IncRef'd below, once we know that there isn't an error.
 		executable:         mm.executable,
 		dumpability:        atomicbitops.FromInt32(mm.dumpability.Load()),
+		coreDumpFilter:     atomicbitops.FromUint32(mm.coreDumpFilter.Load()),
 		aioManager:         aioManager{contexts: make(map[uint64]*AIOContext)},
 		sleepForActivation: mm.sleepForActivation,
 		vdsoSigReturnAddr:  mm.vdsoSigReturnAddr,
@@ -236,6 +241,7 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 	if mm2.executable != nil {
 		mm2.executable.IncRef()
 	}
+	mm.mfp.MemoryFile().MarkSwappable(mm2)
 	return mm2, nil
 }
 
@@ -263,6 +269,7 @@ func (mm *MemoryManager) DecUsers(ctx context.Context) {
 	}
 
 	mm.destroyAIOManager(ctx)
+	mm.mfp.MemoryFile().MarkUnswappable(mm)
 
 	mm.metadataMu.Lock()
 	exe := mm.executable
@@ -173,6 +173,11 @@ type MemoryManager struct {
 	as     platform.AddressSpace `state:"nosave"`
 	active atomicbitops.Int32    `state:"zerovalue"`
 
+	// lastActive is the time, in nanoseconds since the Unix epoch, at which
+	// active last transitioned to zero. lastActive is accessed using atomic
+	// memory operations.
+	lastActive atomicbitops.Int64
+
 	// unmapAllOnActivate indicates that the next Activate call should activate
 	// an empty AddressSpace.
 	//
@@ -201,6 +206,10 @@ type MemoryManager struct {
 	// by metadataMu.
 	dumpability atomicbitops.Int32
 
+	// coreDumpFilter is the set of MMF_DUMP_* bits that determine which
+	// mappings are included in core dumps, as in /proc/[pid]/coredump_filter.
+	coreDumpFilter atomicbitops.Uint32
+
 	metadataMu metadataMutex `state:"nosave"`
 
 	// argv is the application argv. This is set up by the loader and may be
@@ -249,6 +258,11 @@ type MemoryManager struct {
 	// membarrierRSeqEnabled is non-zero if EnableMembarrierRSeq has previously
 	// been called.
 	membarrierRSeqEnabled atomicbitops.Uint32
+
+	// pinnedVM is the number of bytes of sentry memory charged to the
+	// MemoryManager by its users, such as io_uring rings, like
+	// mm_struct::pinned_vm. It is not inherited across fork.
+	pinnedVM atomicbitops.Uint64
 }
 
 // vma represents a virtual memory area.
@@ -301,6 +315,10 @@ type vma struct {
 	// dontfork is the MADV_DONTFORK setting for this vma configured by madvise().
 	dontfork bool
 
+	// secret is true if the memory mapped by this vma may not be accessed by
+	// the sentry. See memmap.MMapOpts.Secret.
+	secret bool
+
 	mlockMode memmap.MLockMode
 
 	// numaPolicy is the NUMA policy for this vma set by mbind().
@@ -481,6 +499,11 @@ type pma struct {
 	// If internalMappings is not empty, it is the cached return value of
 	// file.MapInternal for the memmap.FileRange mapped by this pma.
 	internalMappings safemem.BlockSeq `state:"nosave"`
+
+	// swapAged is true if the pma has not been used since
+	// MemoryManager.SwapOut removed it from the AddressSpace, such that the
+	// next call to MemoryManager.SwapOut may swap out its memory.
+	swapAged bool
 }
 
 // +stateify savable
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"sync/atomic"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
@@ -131,6 +132,7 @@ func (mm *MemoryManager) getPMAsLocked(ctx context.Context, vseg vmaIterator, ar
 	if !pstart.Ok() {
 		pstart = mm.findOrSeekPrevUpperBoundPMA(ar.Start, pend)
 	}
+	mm.markPMAsUsedLocked(pstart, ar)
 	if perr != nil {
 		return pstart, pend, perr
 	}
@@ -169,6 +171,7 @@ func (mm *MemoryManager) getVecPMAsLocked(ctx context.Context, ars hostarch.Addr
 		ar = hostarch.AddrRange{ar.Start.RoundDown(), end}
 
 		_, pend, perr := mm.getPMAsInternalLocked(ctx, mm.vmas.FindSegment(ar.Start), ar, at)
+		mm.markPMAsUsedLocked(mm.pmas.LowerBoundSegment(ar.Start), ar)
 		if perr != nil {
 			return truncatedAddrRangeSeq(ars, arsit, pend.Start()), perr
 		}
@@ -215,6 +218,10 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 	atomic.StoreUintptr(&vma.lastFault, uintptr(ar.Start))
 
 	mf := mm.mfp.MemoryFile()
+	var numaPolicy pgalloc.NUMAPolicy
+	if mf.NUMANodes() > 1 {
+		numaPolicy = pgalloc.NUMAPolicyFromContext(ctx)
+	}
 	// Limit the range we allocate to ar, aligned to privateAllocUnit.
 	maskAR := privateAligned(ar)
 	didUnmapAS := false
@@ -240,6 +247,14 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 				if vma.mappable == nil {
 					// Private anonymous mappings get pmas by allocating.
 					allocAR := optAR.Intersect(maskAR)
+					if mf.NUMANodes() > 1 {
+						// A policy set by mbind(2) overrides the task's policy.
+						p := numaPolicy
+						if vma.numaPolicy&^linux.MPOL_MODE_FLAGS != linux.MPOL_DEFAULT {
+							p.Policy, p.Nodemask = vma.numaPolicy, vma.numaNodemask
+						}
+						opts.Nodes = p.Nodes()
+					}
 					fr, err := mf.Allocate(uint64(allocAR.Length()), opts)
 					if err != nil {
 						return pstart, pgap, err
@@ -691,6 +706,14 @@ func (mm *MemoryManager) Pin(ctx context.Context, ar hostarch.AddrRange, at host
 		}
 		ar.End = vendaddr
 	}
+	if end, err := mm.nonSecretEndLocked(vseg, ar, ignorePermissions); end < ar.End {
+		if end <= ar.Start {
+			mm.mappingMu.RUnlock()
+			return nil, err
+		}
+		ar.End = end
+		verr = err
+	}
 
 	// Ensure that we have usable pmas.
 	mm.activeMu.Lock()
@@ -1016,7 +1039,8 @@ func (pmaSetFunctions) Merge(ar1 hostarch.AddrRange, pma1 pma, ar2 hostarch.Addr
 		pma1.effectivePerms != pma2.effectivePerms ||
 		pma1.maxPerms != pma2.maxPerms ||
 		pma1.needCOW != pma2.needCOW ||
-		pma1.private != pma2.private {
+		pma1.private != pma2.private ||
+		pma1.swapAged != pma2.swapAged {
 		return pma{}, false
 	}
 
@@ -58,6 +58,167 @@ func (mm *MemoryManager) NeedsUpdate(generation int64) bool {
 	return true
 }
 
+// ReadSmapsRollupDataInto is called by fsimpl/proc.smapsRollupData.Generate
+// to implement /proc/[pid]/smaps_rollup.
+func (mm *MemoryManager) ReadSmapsRollupDataInto(ctx context.Context, buf *bytes.Buffer) {
+	// FIXME(b/235153601): Need to replace RLockBypass with RLockBypass
+	// after fixing b/235153601.
+	mm.mappingMu.RLockBypass()
+	defer mm.mappingMu.RUnlockBypass()
+
+	first := mm.vmas.FirstSegment()
+	if !first.Ok() {
+		// Like Linux, print nothing for an empty address space.
+		return
+	}
+	var (
+		stats smapsStats
+		end   hostarch.Addr
+	)
+	for vseg := first; vseg.Ok(); vseg = vseg.NextSegment() {
+		stats.addStats(mm.vmaSmapsStatsLocked(vseg))
+		end = vseg.End()
+	}
+
+	// The vsyscall region isn't included, as in Linux's
+	// fs/proc/task_mmu.c:show_smaps_rollup().
+	mm.MapsCallbackFuncForBuffer(buf)(first.Start(), end, hostarch.NoAccess, "p", 0, 0, 0, 0, "[rollup]")
+	stats.writeTo(buf)
+	fmt.Fprintf(buf, "Locked:         %8d kB\n", stats.locked/1024)
+}
+
+// pssShift is the number of fractional bits in smapsStats.pss, as in Linux's
+// fs/proc/task_mmu.c.
+const pssShift = 12
+
+// smapsStats is the memory usage of a part of an address space, as reported
+// by /proc/[pid]/smaps and /proc/[pid]/smaps_rollup. Sizes are in bytes, and
+// pss is a fixed-point number of bytes with pssShift fractional bits to avoid
+// accumulating rounding errors.
+type smapsStats struct {
+	rss          uint64
+	pss          uint64
+	sharedClean  uint64
+	sharedDirty  uint64
+	privateClean uint64
+	privateDirty uint64
+	anon         uint64
+	locked       uint64
+}
+
+// add accounts for size bytes of resident memory that are mapped by
+// mapCount pmas, including the one being accounted for.
+func (s *smapsStats) add(size, mapCount uint64, dirty bool) {
+	s.rss += size
+	s.pss += (size << pssShift) / mapCount
+	switch {
+	case mapCount > 1 && dirty:
+		s.sharedDirty += size
+	case mapCount > 1:
+		s.sharedClean += size
+	case dirty:
+		s.privateDirty += size
+	default:
+		s.privateClean += size
+	}
+}
+
+// addStats adds o to s.
+func (s *smapsStats) addStats(o smapsStats) {
+	s.rss += o.rss
+	s.pss += o.pss
+	s.sharedClean += o.sharedClean
+	s.sharedDirty += o.sharedDirty
+	s.privateClean += o.privateClean
+	s.privateDirty += o.privateDirty
+	s.anon += o.anon
+	s.locked += o.locked
+}
+
+// writeTo writes the fields from Rss to SwapPss of a smaps entry to b.
+func (s *smapsStats) writeTo(b *bytes.Buffer) {
+	fmt.Fprintf(b, "Rss:            %8d kB\n", s.rss/1024)
+	fmt.Fprintf(b, "Pss:            %8d kB\n", (s.pss>>pssShift)/1024)
+	fmt.Fprintf(b, "Shared_Clean:   %8d kB\n", s.sharedClean/1024)
+	fmt.Fprintf(b, "Shared_Dirty:   %8d kB\n", s.sharedDirty/1024)
+	fmt.Fprintf(b, "Private_Clean:  %8d kB\n", s.privateClean/1024)
+	fmt.Fprintf(b, "Private_Dirty:  %8d kB\n", s.privateDirty/1024)
+	// Pretend that all pages are "referenced" (recently touched).
+	fmt.Fprintf(b, "Referenced:     %8d kB\n", s.rss/1024)
+	fmt.Fprintf(b, "Anonymous:      %8d kB\n", s.anon/1024)
+	// Hugepages (hugetlb and THP) are not implemented.
+	fmt.Fprintf(b, "AnonHugePages:  %8d kB\n", 0)
+	fmt.Fprintf(b, "Shared_Hugetlb: %8d kB\n", 0)
+	fmt.Fprintf(b, "Private_Hugetlb: %7d kB\n", 0)
+	// Swap is not implemented.
+	fmt.Fprintf(b, "Swap:           %8d kB\n", 0)
+	fmt.Fprintf(b, "SwapPss:        %8d kB\n", 0)
+}
+
+// vmaSmapsStatsLocked returns the memory usage of the vma iterated by vseg.
+//
+// Preconditions: mm.mappingMu must be locked.
+func (mm *MemoryManager) vmaSmapsStatsLocked(vseg vmaIterator) smapsStats {
+	vma := vseg.ValuePtr()
+	mf := mm.mfp.MemoryFile()
+	// Pretend that all pages are dirty if the vma is writable, and clean
+	// otherwise.
+	dirty := vma.effectivePerms.Write
+	var stats smapsStats
+
+	// We take mm.activeMu here in each call to vmaSmapsStatsLocked, instead of
+	// requiring it to be locked as a precondition, to reduce the latency
+	// impact of reading /proc/[pid]/smaps on concurrent performance-sensitive
+	// operations requiring activeMu for writing like faults.
+	mm.activeMu.RLock()
+	vsegAR := vseg.Range()
+	for pseg := mm.pmas.LowerBoundSegment(vsegAR.Start); pseg.Ok() && pseg.Start() < vsegAR.End; pseg = pseg.NextSegment() {
+		psegAR := pseg.Range().Intersect(vsegAR)
+		fr := pseg.fileRangeOf(psegAR)
+		pma := pseg.ValuePtr()
+		var accounted uint64
+		switch {
+		case pma.private:
+			stats.anon += psegAR.Length()
+			// Private memory is shared by the MemoryManagers that hold a
+			// private reference on it, e.g. after fork() and before COW.
+			mm.privateRefs.mu.Lock()
+			for rseg := mm.privateRefs.refs.LowerBoundSegment(fr.Start); rseg.Ok() && rseg.Start() < fr.End; rseg = rseg.NextSegment() {
+				size := rseg.Range().Intersect(fr).Length()
+				stats.add(size, uint64(rseg.Value()), dirty)
+				accounted += size
+			}
+			mm.privateRefs.mu.Unlock()
+		case pma.file == memmap.File(mf):
+			// Each pma mapping shared MemoryFile pages holds a reference on
+			// them, in addition to the one held by their owner (e.g. a tmpfs
+			// file), so the number of mappings is the reference count minus
+			// one. Transient references, e.g. from pinning, can only make the
+			// count larger than the number of mappings.
+			mf.ForEachRefCount(fr, func(subFR memmap.FileRange, refs uint64) {
+				mapCount := uint64(1)
+				if refs > 2 {
+					mapCount = refs - 1
+				}
+				stats.add(subFR.Length(), mapCount, dirty)
+				accounted += subFR.Length()
+			})
+		}
+		// Pages of other Files (e.g. host files mapped directly) can't be
+		// attributed, so Pss is approximated as Rss for them, i.e. we pretend
+		// that they are only mapped by this pma.
+		if rest := psegAR.Length() - accounted; rest > 0 {
+			stats.add(rest, 1, dirty)
+		}
+	}
+	mm.activeMu.RUnlock()
+
+	if vma.mlockMode != memmap.MLockNone {
+		stats.locked = stats.rss
+	}
+	return stats
+}
+
 // MapsCallbackFuncForBuffer creates a /proc/[pid]/maps entry including the trailing newline.
 func (mm *MemoryManager) MapsCallbackFuncForBuffer(buf *bytes.Buffer) MapsCallbackFunc {
 	return func(start, end hostarch.Addr, permissions hostarch.AccessType, private string, offset uint64, devMajor, devMinor uint32, inode uint64, path string) {
@@ -253,59 +414,13 @@ func (mm *MemoryManager) vmaSmapsEntryLocked(ctx context.Context, vseg vmaIterat
 func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIterator, b *bytes.Buffer) {
 	mm.appendVMAMapsEntryLocked(ctx, vseg, mm.MapsCallbackFuncForBuffer(b))
 	vma := vseg.ValuePtr()
-
-	// We take mm.activeMu here in each call to vmaSmapsEntryLocked, instead of
-	// requiring it to be locked as a precondition, to reduce the latency
-	// impact of reading /proc/[pid]/smaps on concurrent performance-sensitive
-	// operations requiring activeMu for writing like faults.
-	mm.activeMu.RLock()
-	var rss uint64
-	var anon uint64
-	vsegAR := vseg.Range()
-	for pseg := mm.pmas.LowerBoundSegment(vsegAR.Start); pseg.Ok() && pseg.Start() < vsegAR.End; pseg = pseg.NextSegment() {
-		psegAR := pseg.Range().Intersect(vsegAR)
-		size := uint64(psegAR.Length())
-		rss += size
-		if pseg.ValuePtr().private {
-			anon += size
-		}
-	}
-	mm.activeMu.RUnlock()
+	stats := mm.vmaSmapsStatsLocked(vseg)
 
 	fmt.Fprintf(b, "Size:           %8d kB\n", vseg.Range().Length()/1024)
-	fmt.Fprintf(b, "Rss:            %8d kB\n", rss/1024)
-	// Currently we report PSS = RSS, i.e. we pretend each page mapped by a pma
-	// is only mapped by that pma. This avoids having to query memmap.Mappables
-	// for reference count information on each page. As a corollary, all pages
-	// are accounted as "private" whether or not the vma is private; compare
-	// Linux's fs/proc/task_mmu.c:smaps_account().
-	fmt.Fprintf(b, "Pss:            %8d kB\n", rss/1024)
-	fmt.Fprintf(b, "Shared_Clean:   %8d kB\n", 0)
-	fmt.Fprintf(b, "Shared_Dirty:   %8d kB\n", 0)
-	// Pretend that all pages are dirty if the vma is writable, and clean otherwise.
-	clean := rss
-	if vma.effectivePerms.Write {
-		clean = 0
-	}
-	fmt.Fprintf(b, "Private_Clean:  %8d kB\n", clean/1024)
-	fmt.Fprintf(b, "Private_Dirty:  %8d kB\n", (rss-clean)/1024)
-	// Pretend that all pages are "referenced" (recently touched).
-	fmt.Fprintf(b, "Referenced:     %8d kB\n", rss/1024)
-	fmt.Fprintf(b, "Anonymous:      %8d kB\n", anon/1024)
-	// Hugepages (hugetlb and THP) are not implemented.
-	fmt.Fprintf(b, "AnonHugePages:  %8d kB\n", 0)
-	fmt.Fprintf(b, "Shared_Hugetlb: %8d kB\n", 0)
-	fmt.Fprintf(b, "Private_Hugetlb: %7d kB\n", 0)
-	// Swap is not implemented.
-	fmt.Fprintf(b, "Swap:           %8d kB\n", 0)
-	fmt.Fprintf(b, "SwapPss:        %8d kB\n", 0)
+	stats.writeTo(b)
 	fmt.Fprintf(b, "KernelPageSize: %8d kB\n", hostarch.PageSize/1024)
 	fmt.Fprintf(b, "MMUPageSize:    %8d kB\n", hostarch.PageSize/1024)
-	locked := rss
-	if vma.mlockMode == memmap.MLockNone {
-		locked = 0
-	}
-	fmt.Fprintf(b, "Locked:         %8d kB\n", locked/1024)
+	fmt.Fprintf(b, "Locked:         %8d kB\n", stats.locked/1024)
 
 	b.WriteString("VmFlags: ")
 	if vma.realPerms.Read {
@@ -54,4 +54,7 @@ func (mm *MemoryManager) afterLoad() {
 	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); pseg = pseg.NextSegment() {
 		pseg.ValuePtr().file = mf
 	}
+	if mm.users.Load() > 0 {
+		mf.MarkSwappable(mm)
+	}
 }
@@ -0,0 +1,137 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+// SwapOut implements pgalloc.SwappableMemoryUser.SwapOut.
+//
+// Private memory is swapped out in two steps: pmas are first removed from the
+// AddressSpace and marked aged, so that their next use is observed by
+// getPMAsLocked; the memory of pmas that are still aged by the next call to
+// SwapOut is then swapped out.
+func (mm *MemoryManager) SwapOut(ctx context.Context, length uint64) uint64 {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	mf := mm.mfp.MemoryFile()
+	var done uint64
+	for pseg := mm.pmas.FirstSegment(); pseg.Ok() && done < length; pseg = pseg.NextSegment() {
+		pma := pseg.ValuePtr()
+		if !pma.private || mm.isMLockedLocked(pseg.Range()) {
+			continue
+		}
+		if !pma.swapAged {
+			mm.unmapASLocked(pseg.Range())
+			pma.internalMappings = safemem.BlockSeq{}
+			pma.swapAged = true
+			continue
+		}
+		// Memory shared with other MemoryManagers after fork() may be mapped
+		// by them.
+		if !mm.isPrivatelyOwnedLocked(pseg) {
+			continue
+		}
+		n, err := mf.SwapOut(pseg.fileRange(), length-done)
+		done += n
+		if err != nil {
+			log.Warningf("Failed to swap out %v: %v", pseg.Range(), err)
+			break
+		}
+	}
+	return done
+}
+
+// LastUsed implements pgalloc.SwappableMemoryUser.LastUsed.
+func (mm *MemoryManager) LastUsed() int64 {
+	if mm.active.Load() > 0 {
+		return time.Now().UnixNano()
+	}
+	return mm.lastActive.Load()
+}
+
+// SwapSize returns the number of bytes of mm's private memory that are stored
+// in the MemoryFile's swap file.
+func (mm *MemoryManager) SwapSize() uint64 {
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	return mm.swapSizeLocked()
+}
+
+// Preconditions: mm.activeMu must be locked.
+func (mm *MemoryManager) swapSizeLocked() uint64 {
+	mf := mm.mfp.MemoryFile()
+	if !mf.SwapEnabled() {
+		return 0
+	}
+	var swapped uint64
+	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); pseg = pseg.NextSegment() {
+		if pseg.ValuePtr().private {
+			swapped += mf.SwappedLength(pseg.fileRange())
+		}
+	}
+	return swapped
+}
+
+// markPMAsUsedLocked clears swapAged for all pmas containing addresses in ar,
+// starting at pseg.
+//
+// Preconditions: mm.activeMu must be locked for writing.
+func (mm *MemoryManager) markPMAsUsedLocked(pseg pmaIterator, ar hostarch.AddrRange) {
+	if !mm.mfp.MemoryFile().SwapEnabled() {
+		return
+	}
+	for ; pseg.Ok() && pseg.Start() < ar.End; pseg = pseg.NextSegment() {
+		pseg.ValuePtr().swapAged = false
+	}
+}
+
+// isMLockedLocked returns true if any vma containing an address in ar is
+// mlocked.
+//
+// Preconditions: mm.mappingMu must be locked.
+func (mm *MemoryManager) isMLockedLocked(ar hostarch.AddrRange) bool {
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		if vseg.ValuePtr().mlockMode != memmap.MLockNone {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrivatelyOwnedLocked returns true if mm holds the only private reference
+// on the memory mapped by pseg.
+//
+// Preconditions:
+//   - mm.activeMu must be locked.
+//   - pseg.ValuePtr().private == true.
+func (mm *MemoryManager) isPrivatelyOwnedLocked(pseg pmaIterator) bool {
+	mm.privateRefs.mu.Lock()
+	defer mm.privateRefs.mu.Unlock()
+	fr := pseg.fileRange()
+	// This check relies on mm.privateRefs.refs being kept fully merged.
+	rseg := mm.privateRefs.refs.FindSegment(fr.Start)
+	return rseg.Ok() && rseg.Value() == 1 && fr.End <= rseg.End()
+}
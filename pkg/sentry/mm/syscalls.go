@@ -22,6 +22,7 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/futex"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
@@ -1016,6 +1017,26 @@ func (mm *MemoryManager) NumaPolicy(addr hostarch.Addr) (linux.NumaPolicy, uint6
 	return vma.numaPolicy, vma.numaNodemask, nil
 }
 
+// NumaNode returns the NUMA node of the page mapped at addr, as for Linux's
+// get_mempolicy(MPOL_F_NODE | MPOL_F_ADDR). Pages that have not been faulted
+// in, or that aren't backed by a pgalloc.MemoryFile, are reported to be on
+// node 0.
+func (mm *MemoryManager) NumaNode(addr hostarch.Addr) int {
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	addr = addr.RoundDown()
+	pseg := mm.pmas.FindSegment(addr)
+	if !pseg.Ok() {
+		return 0
+	}
+	pma := pseg.ValuePtr()
+	mf, ok := pma.file.(*pgalloc.MemoryFile)
+	if !ok {
+		return 0
+	}
+	return mf.NUMANodeOf(pma.off + uint64(addr-pseg.Start()))
+}
+
 // SetNumaPolicy implements the semantics of Linux's mbind().
 func (mm *MemoryManager) SetNumaPolicy(addr hostarch.Addr, length uint64, policy linux.NumaPolicy, nodemask uint64) error {
 	if !addr.IsPageAligned() {
@@ -1142,6 +1163,91 @@ func (mm *MemoryManager) Decommit(addr hostarch.Addr, length uint64) error {
 	return nil
 }
 
+// Pageout implements the semantics of Linux's madvise(MADV_COLD) if cold is
+// true, and madvise(MADV_PAGEOUT) otherwise.
+//
+// For MADV_PAGEOUT, pmas that map memory that is retained elsewhere, such as
+// the page cache of a shared file mapping, are invalidated so that the
+// memory can be reclaimed by its owner, and zero-filled pages of private
+// memory that is not shared with other MemoryManagers are decommitted. In
+// both cases, the remaining memory is marked as a preferred target for
+// reclaim by the host.
+func (mm *MemoryManager) Pageout(addr hostarch.Addr, length uint64, cold bool) error {
+	ar, ok := addr.ToRange(length)
+	if !ok {
+		return linuxerr.EINVAL
+	}
+
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	mf := mm.mfp.MemoryFile()
+	var didUnmapAS bool
+	pseg := mm.pmas.LowerBoundSegment(ar.Start)
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		if vma.mlockMode != memmap.MLockNone {
+			return linuxerr.EINVAL
+		}
+		vsegAR := vseg.Range().Intersect(ar)
+		for pseg.Ok() && pseg.Start() < vsegAR.End {
+			psegAR := pseg.Range().Intersect(vsegAR)
+			pma := pseg.ValuePtr()
+			if cold {
+				if pma.file == mf {
+					mf.Pageout(pseg.fileRangeOf(psegAR), cold)
+				}
+				pseg = pseg.NextSegment()
+				continue
+			}
+			if !didUnmapAS {
+				// AddressSpace mappings must be removed before pmas are
+				// invalidated, and before the memory they map can be
+				// decommitted without racing with application writes.
+				mm.unmapASLocked(ar)
+				didUnmapAS = true
+			}
+			if !pma.private {
+				// The mapped memory is owned by the memmap.Mappable, which
+				// retains its contents.
+				pseg = mm.pmas.Isolate(pseg, vsegAR)
+				pma = pseg.ValuePtr()
+				pma.file.DecRef(pseg.fileRange())
+				mm.removeRSSLocked(pseg.Range())
+				pseg = mm.pmas.Remove(pseg).NextSegment()
+				continue
+			}
+			fr := pseg.fileRangeOf(psegAR)
+			if pma.file == mf {
+				// Private memory with more than one reference may be
+				// shared copy-on-write with another MemoryManager, whose
+				// view of it must not be affected.
+				var unsharedFRs []memmap.FileRange
+				mf.ForEachRefCount(fr, func(subFR memmap.FileRange, refs uint64) {
+					if refs == 1 {
+						unsharedFRs = append(unsharedFRs, subFR)
+					}
+				})
+				for _, ufr := range unsharedFRs {
+					if _, err := mf.DecommitZeroPages(ufr); err != nil {
+						log.Warningf("Failed to decommit zero pages in %v: %v", ufr, err)
+					}
+				}
+				mf.Pageout(fr, cold)
+			}
+			pseg = pseg.NextSegment()
+		}
+	}
+
+	// As in Decommit, unmapped parts of ar are ignored but cause ENOMEM.
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		return linuxerr.ENOMEM
+	}
+	return nil
+}
+
 // MSyncOpts holds options to MSync.
 type MSyncOpts struct {
 	// Sync has the semantics of MS_SYNC.
@@ -1276,11 +1382,71 @@ func (mm *MemoryManager) VirtualMemorySizeRange(ar hostarch.AddrRange) uint64 {
 	return uint64(mm.vmas.SpanRange(ar))
 }
 
+// Mincore returns whether each page in ar is resident, as for mincore(2).
+// Pages of file mappings whose Mappable implements memmap.CachedMappable are
+// resident if they are cached by the Mappable or, in private mappings, have
+// been copied-on-write. All other mapped pages are reported resident. If ar
+// contains unmapped addresses, Mincore returns ENOMEM.
+//
+// Preconditions: ar.Length() != 0. ar must be page-aligned.
+func (mm *MemoryManager) Mincore(ar hostarch.AddrRange) ([]byte, error) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		return nil, linuxerr.ENOMEM
+	}
+
+	vec := make([]byte, ar.Length()/hostarch.PageSize)
+	setResident := func(rar hostarch.AddrRange) {
+		for i := (rar.Start - ar.Start) / hostarch.PageSize; i < (rar.End-ar.Start)/hostarch.PageSize; i++ {
+			vec[i] = 1
+		}
+	}
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		vr := vseg.Range().Intersect(ar)
+		cm, ok := vma.mappable.(memmap.CachedMappable)
+		if !ok {
+			setResident(vr)
+			continue
+		}
+		cm.CachedRanges(vseg.mappableRangeOf(vr), func(mr memmap.MappableRange) {
+			setResident(vseg.addrRangeOf(mr))
+		})
+		if vma.private {
+			mm.activeMu.RLock()
+			for pseg := mm.pmas.LowerBoundSegment(vr.Start); pseg.Ok() && pseg.Start() < vr.End; pseg = pseg.NextSegment() {
+				if pseg.ValuePtr().private {
+					setResident(pseg.Range().Intersect(vr))
+				}
+			}
+			mm.activeMu.RUnlock()
+		}
+	}
+	return vec, nil
+}
+
 // ResidentSetSize returns the value advertised as mm's RSS in bytes.
 func (mm *MemoryManager) ResidentSetSize() uint64 {
 	mm.activeMu.RLock()
 	defer mm.activeMu.RUnlock()
-	return mm.curRSS
+	return mm.curRSS - mm.swapSizeLocked()
+}
+
+// ResidentSetSizeBreakdown returns the portions of mm's RSS in bytes that are
+// private anonymous memory and file-backed or shared memory respectively,
+// corresponding to Linux's MM_ANONPAGES and MM_FILEPAGES + MM_SHMEMPAGES.
+func (mm *MemoryManager) ResidentSetSizeBreakdown() (anon, file uint64) {
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); pseg = pseg.NextSegment() {
+		if pseg.ValuePtr().private {
+			anon += uint64(pseg.Range().Length())
+		} else {
+			file += uint64(pseg.Range().Length())
+		}
+	}
+	return anon - mm.swapSizeLocked(), file
 }
 
 // MaxResidentSetSize returns the value advertised as mm's max RSS in bytes.
@@ -1297,6 +1463,23 @@ func (mm *MemoryManager) VirtualDataSize() uint64 {
 	return mm.dataAS
 }
 
+// PinnedMemorySize returns the number of bytes charged to mm by
+// IncPinnedMemory.
+func (mm *MemoryManager) PinnedMemorySize() uint64 {
+	return mm.pinnedVM.Load()
+}
+
+// IncPinnedMemory charges n bytes of memory that is not otherwise accounted
+// for in mm's mappings to mm.
+func (mm *MemoryManager) IncPinnedMemory(n uint64) {
+	mm.pinnedVM.Add(n)
+}
+
+// DecPinnedMemory releases n bytes previously charged by IncPinnedMemory.
+func (mm *MemoryManager) DecPinnedMemory(n uint64) {
+	mm.pinnedVM.Add(^(n - 1))
+}
+
 // EnableMembarrierPrivate causes future calls to IsMembarrierPrivateEnabled to
 // return true.
 func (mm *MemoryManager) EnableMembarrierPrivate() {
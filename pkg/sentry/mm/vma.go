@@ -121,6 +121,7 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 		growsDown:      opts.GrowsDown,
 		mlockMode:      opts.MLockMode,
 		numaPolicy:     linux.MPOL_DEFAULT,
+		secret:         opts.Secret,
 		id:             opts.MappingIdentity,
 		hint:           opts.Hint,
 	}
@@ -318,6 +319,26 @@ func (mm *MemoryManager) getVMAsLocked(ctx context.Context, ar hostarch.AddrRang
 	return vbegin, vgap, linuxerr.EFAULT
 }
 
+// nonSecretEndLocked returns the end of the longest prefix of ar, which must
+// start in vseg, that doesn't overlap any secret vma, and the error to return
+// for I/O to the remainder of ar, if any. Accesses that ignore permissions
+// (e.g. ptrace(PTRACE_PEEKDATA)) fail with EPERM; other accesses fail with
+// EFAULT, consistent with the kernel being unable to access secretmem pages in
+// Linux.
+//
+// Preconditions: mm.mappingMu must be locked.
+func (mm *MemoryManager) nonSecretEndLocked(vseg vmaIterator, ar hostarch.AddrRange, ignorePermissions bool) (hostarch.Addr, error) {
+	for ; vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		if vseg.ValuePtr().secret {
+			if ignorePermissions {
+				return vseg.Start(), linuxerr.EPERM
+			}
+			return vseg.Start(), linuxerr.EFAULT
+		}
+	}
+	return ar.End, nil
+}
+
 // getVecVMAsLocked ensures that vmas exist for all addresses in ars, and
 // support access to type of (at, ignorePermissions). It returns the subset of
 // ars for which vmas exist. If this is not equal to ars, it returns a non-nil
@@ -333,9 +354,13 @@ func (mm *MemoryManager) getVecVMAsLocked(ctx context.Context, ars hostarch.Addr
 		if ar.Length() == 0 {
 			continue
 		}
-		if _, vend, err := mm.getVMAsLocked(ctx, ar, at, ignorePermissions); err != nil {
+		vseg, vend, err := mm.getVMAsLocked(ctx, ar, at, ignorePermissions)
+		if err != nil {
 			return truncatedAddrRangeSeq(ars, arsit, vend.Start()), err
 		}
+		if end, err := mm.nonSecretEndLocked(vseg, ar, ignorePermissions); err != nil {
+			return truncatedAddrRangeSeq(ars, arsit, end), err
+		}
 	}
 	return ars, nil
 }
@@ -469,6 +494,7 @@ func (vmaSetFunctions) Merge(ar1 hostarch.AddrRange, vma1 vma, ar2 hostarch.Addr
 		vma1.numaPolicy != vma2.numaPolicy ||
 		vma1.numaNodemask != vma2.numaNodemask ||
 		vma1.dontfork != vma2.dontfork ||
+		vma1.secret != vma2.secret ||
 		vma1.id != vma2.id ||
 		vma1.hint != vma2.hint {
 		return vma{}, false
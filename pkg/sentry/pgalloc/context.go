@@ -15,6 +15,7 @@
 package pgalloc
 
 import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 )
 
@@ -27,6 +28,10 @@ const (
 
 	// CtxMemoryFileProvider is a Context.Value key for a MemoryFileProvider.
 	CtxMemoryFileProvider
+
+	// CtxNUMAPolicy is a Context.Value key for the NUMAPolicy that applies to
+	// memory allocated on behalf of the context.
+	CtxNUMAPolicy
 )
 
 // MemoryFileFromContext returns the MemoryFile used by ctx, or nil if no such
@@ -38,6 +43,15 @@ func MemoryFileFromContext(ctx context.Context) *MemoryFile {
 	return nil
 }
 
+// NUMAPolicyFromContext returns the NUMAPolicy used by ctx. If ctx doesn't
+// have a NUMAPolicy, it returns the default policy.
+func NUMAPolicyFromContext(ctx context.Context) NUMAPolicy {
+	if v := ctx.Value(CtxNUMAPolicy); v != nil {
+		return v.(NUMAPolicy)
+	}
+	return NUMAPolicy{Policy: linux.MPOL_DEFAULT}
+}
+
 // MemoryFileProviderFromContext returns the MemoryFileProvider used by ctx, or nil if no such
 // MemoryFileProvider exists.
 func MemoryFileProviderFromContext(ctx context.Context) MemoryFileProvider {
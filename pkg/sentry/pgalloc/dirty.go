@@ -0,0 +1,180 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"hash/maphash"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+// dirtyCopyBatch is the maximum number of bytes that DirtyTracker reads from a
+// MemoryFile at a time.
+const dirtyCopyBatch = 256 * hostarch.PageSize
+
+// DirtyTracker tracks which pages in a MemoryFile have changed since their
+// contents were last copied. This allows memory to be copied iteratively
+// while the MemoryFile is in use ("pre-copy"), followed by a final SaveTo
+// (with SaveOpts.Precopied) that only copies the pages that changed since.
+//
+// As described in MemoryFile, we do not have direct access to the MMU, so
+// pages are detected to be dirty by comparing a hash of their contents to the
+// hash of their contents when they were last copied. A change to a page is
+// only missed if the two 64-bit hashes collide.
+//
+// DirtyTracker assumes that the destination that pages are copied to
+// initially contains only zeroes, e.g. that it is a new sparse file.
+// DirtyTracker is not safe for concurrent use.
+type DirtyTracker struct {
+	f *MemoryFile
+
+	// seed seeds page hashes. seed is immutable.
+	seed maphash.Seed
+
+	// zeroHash is the hash of a page containing only zeroes. zeroHash is
+	// immutable.
+	zeroHash uint64
+
+	// hashes maps the offset of each page that was copied to the hash of its
+	// contents when it was copied. The destination contains zeroes for pages
+	// that are not in hashes.
+	hashes map[uint64]uint64
+
+	// buf holds the contents of pages while they are hashed and written, so
+	// that pages that are written concurrently are hashed and written
+	// consistently.
+	buf []byte
+}
+
+// TrackDirty returns a DirtyTracker for f, for which no pages have been
+// copied yet.
+func (f *MemoryFile) TrackDirty() *DirtyTracker {
+	t := &DirtyTracker{
+		f:      f,
+		seed:   maphash.MakeSeed(),
+		hashes: make(map[uint64]uint64),
+		buf:    make([]byte, dirtyCopyBatch),
+	}
+	t.zeroHash = t.hash(make([]byte, hostarch.PageSize))
+	return t
+}
+
+// hash returns the hash of the contents of the page pg.
+func (t *DirtyTracker) hash(pg []byte) uint64 {
+	var h maphash.Hash
+	h.SetSeed(t.seed)
+	h.Write(pg)
+	return h.Sum64()
+}
+
+// Copy writes the contents of committed pages that have changed since they
+// were last copied to w, at their offsets in the MemoryFile, and returns the
+// number of bytes written. Copy may be called while the MemoryFile is in use;
+// pages that are written concurrently are copied again by a later call to
+// Copy or SaveTo.
+func (t *DirtyTracker) Copy(w io.WriterAt) (uint64, error) {
+	f := t.f
+	if l := f.lazy; l != nil {
+		if err := l.loadAll(f); err != nil {
+			return 0, err
+		}
+	}
+
+	// Only read pages that are known to be committed, since reading an
+	// uncommitted page would commit it.
+	if err := f.UpdateUsage(); err != nil {
+		return 0, err
+	}
+	var frs []memmap.FileRange
+	f.mu.Lock()
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if val := seg.ValuePtr(); val.knownCommitted && !val.unsavable {
+			frs = append(frs, seg.Range())
+		}
+	}
+	f.mu.Unlock()
+
+	var written uint64
+	for _, fr := range frs {
+		n, err := t.copyRange(fr, w)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// copyRange writes the contents of pages in fr that have changed since they
+// were last copied to w, and returns the number of bytes written.
+func (t *DirtyTracker) copyRange(fr memmap.FileRange, w io.WriterAt) (uint64, error) {
+	var written uint64
+	for start := fr.Start; start < fr.End; {
+		end := start + dirtyCopyBatch
+		if end > fr.End {
+			end = fr.End
+		}
+		buf := t.buf[:end-start]
+		n := 0
+		if err := t.f.forEachMappingSlice(memmap.FileRange{start, end}, func(s []byte) {
+			n += copy(buf[n:], s)
+		}); err != nil {
+			return written, err
+		}
+
+		// Write out each run of dirty pages.
+		run := -1
+		for i := 0; i <= len(buf); i += hostarch.PageSize {
+			if i < len(buf) && t.update(start+uint64(i), buf[i:i+hostarch.PageSize]) {
+				if run < 0 {
+					run = i
+				}
+				continue
+			}
+			if run < 0 {
+				continue
+			}
+			if _, err := w.WriteAt(buf[run:i], int64(start)+int64(run)); err != nil {
+				return written, err
+			}
+			written += uint64(i - run)
+			run = -1
+		}
+		start = end
+	}
+	return written, nil
+}
+
+// update records that the page at offset off is being copied with the
+// contents pg, and returns true if they differ from the contents it was last
+// copied with.
+func (t *DirtyTracker) update(off uint64, pg []byte) bool {
+	h := t.hash(pg)
+	prev, ok := t.hashes[off]
+	if !ok {
+		prev = t.zeroHash
+	}
+	if h == prev {
+		return false
+	}
+	if h == t.zeroHash {
+		delete(t.hashes, off)
+	} else {
+		t.hashes[off] = h
+	}
+	return true
+}
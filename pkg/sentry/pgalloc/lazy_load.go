@@ -0,0 +1,238 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// lazyChunkSize is the granularity at which page contents are loaded from a
+// pages file.
+const lazyChunkSize = hostarch.HugePageSize
+
+// errLazyLoaderStopped is returned when pages are accessed after their
+// MemoryFile was destroyed.
+var errLazyLoaderStopped = errors.New("pages file loader stopped")
+
+// lazyChunk is a range of pages whose contents are stored in a pages file.
+type lazyChunk struct {
+	// fr is the range of pages in the MemoryFile. fr is immutable.
+	fr memmap.FileRange
+
+	// off is the offset of the contents of fr in the pages file. off is
+	// immutable.
+	off uint64
+
+	// loaded is true if the contents of the chunk have been loaded, or don't
+	// need to be. loaded is protected by lazyLoader.mu.
+	loaded bool
+}
+
+// lazyLoader loads the contents of a MemoryFile from a pages file written by
+// MemoryFile.SaveTo, either on demand or in the background.
+type lazyLoader struct {
+	// src is the pages file. src is closed once all chunks are loaded.
+	src *os.File
+
+	// remaining is the number of chunks that aren't loaded yet. remaining is
+	// only mutated with mu locked, but may be read without it so that
+	// accesses to a fully loaded MemoryFile don't need to lock mu.
+	remaining atomicbitops.Int64
+
+	// mu serializes loads from src.
+	mu sync.Mutex
+
+	// chunks are sorted by fr.Start.
+	chunks []lazyChunk
+
+	// stopped is set when the MemoryFile is destroyed. stopped is protected
+	// by mu.
+	stopped bool
+}
+
+func newLazyLoader(src *os.File, chunks []lazyChunk) *lazyLoader {
+	l := &lazyLoader{
+		src:    src,
+		chunks: chunks,
+	}
+	l.remaining.Store(int64(len(chunks)))
+	return l
+}
+
+// done returns true if all chunks have been loaded.
+func (l *lazyLoader) done() bool {
+	return l.remaining.Load() == 0
+}
+
+// firstChunk returns the index of the first chunk that ends after off.
+func (l *lazyLoader) firstChunk(off uint64) int {
+	return sort.Search(len(l.chunks), func(i int) bool {
+		return l.chunks[i].fr.End > off
+	})
+}
+
+// markLoadedLocked marks the chunk at index i as loaded.
+//
+// Preconditions: l.mu must be locked.
+func (l *lazyLoader) markLoadedLocked(i int) {
+	l.chunks[i].loaded = true
+	if l.remaining.Add(-1) == 0 {
+		if err := l.src.Close(); err != nil {
+			log.Warningf("Failed to close pages file: %v", err)
+		}
+	}
+}
+
+// loadChunkLocked reads the contents of the chunk at index i into f if it
+// isn't loaded yet.
+//
+// Preconditions: l.mu must be locked.
+func (l *lazyLoader) loadChunkLocked(f *MemoryFile, i int) error {
+	c := &l.chunks[i]
+	if c.loaded {
+		return nil
+	}
+	if l.stopped {
+		return errLazyLoaderStopped
+	}
+	off := int64(c.off)
+	var ioErr error
+	err := f.forEachMappingSlice(c.fr, func(s []byte) {
+		if ioErr != nil {
+			return
+		}
+		var n int
+		n, ioErr = l.src.ReadAt(s, off)
+		off += int64(n)
+	})
+	if ioErr != nil {
+		return fmt.Errorf("reading pages %v from pages file: %w", c.fr, ioErr)
+	}
+	if err != nil {
+		return err
+	}
+	l.markLoadedLocked(i)
+	return nil
+}
+
+// loadAll loads all remaining chunks in order.
+func (l *lazyLoader) loadAll(f *MemoryFile) error {
+	for i := range l.chunks {
+		l.mu.Lock()
+		err := l.loadChunkLocked(f, i)
+		l.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefetch loads all remaining chunks in the background, so that the
+// MemoryFile eventually stops depending on the pages file. Chunks that fail
+// to load are retried when they're accessed.
+func (l *lazyLoader) prefetch(f *MemoryFile) {
+	start := time.Now()
+	for i := range l.chunks {
+		l.mu.Lock()
+		err := l.loadChunkLocked(f, i)
+		l.mu.Unlock()
+		if err == errLazyLoaderStopped {
+			return
+		}
+		if err != nil {
+			log.Warningf("Prefetching pages failed: %v", err)
+		}
+	}
+	log.Infof("Pages file prefetch took [%s].", time.Since(start))
+}
+
+// stop prevents further loads from the pages file.
+func (l *lazyLoader) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.stopped && !l.done() {
+		l.src.Close()
+	}
+	l.stopped = true
+}
+
+// LazyLoading returns true if the contents of some pages in f are still being
+// loaded from a pages file, or are stored in f's swap file. In this case,
+// EnsureLoaded must be called before pages are mapped by means other than
+// MapInternal, e.g. in an AddressSpace.
+func (f *MemoryFile) LazyLoading() bool {
+	return (f.lazy != nil && !f.lazy.done()) || f.swapped.Load() != 0
+}
+
+// EnsureLoaded loads the contents of pages in fr that are still only stored
+// in the pages file f was loaded from, or in f's swap file.
+func (f *MemoryFile) EnsureLoaded(fr memmap.FileRange) error {
+	if err := f.ensureLazyLoaded(fr); err != nil {
+		return err
+	}
+	return f.swapIn(fr)
+}
+
+// ensureLazyLoaded loads the contents of pages in fr that are still only
+// stored in the pages file f was loaded from.
+func (f *MemoryFile) ensureLazyLoaded(fr memmap.FileRange) error {
+	l := f.lazy
+	if l == nil || l.done() {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := l.firstChunk(fr.Start); i < len(l.chunks) && l.chunks[i].fr.Start < fr.End; i++ {
+		if err := l.loadChunkLocked(f, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discardLazy is called before the contents of pages in fr are discarded, so
+// that they won't be overwritten by a later load from the pages file.
+func (f *MemoryFile) discardLazy(fr memmap.FileRange) {
+	l := f.lazy
+	if l == nil || l.done() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := l.firstChunk(fr.Start); i < len(l.chunks) && l.chunks[i].fr.Start < fr.End; i++ {
+		if l.chunks[i].loaded {
+			continue
+		}
+		if fr.IsSupersetOf(l.chunks[i].fr) {
+			l.markLoadedLocked(i)
+			continue
+		}
+		// Pages in the chunk outside of fr are still in use.
+		if err := l.loadChunkLocked(f, i); err != nil {
+			log.Warningf("Loading partially discarded pages failed: %v", err)
+		}
+	}
+}
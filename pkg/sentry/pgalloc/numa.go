@@ -0,0 +1,183 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+// NUMA placement:
+//
+// If MemoryFileOpts.HostNUMANodes is non-empty, each chunk of the backing file
+// is bound to host NUMA nodes when the file is expanded. Since the backing
+// file is a shmem file, binding a range of a shared mapping of it sets the
+// policy for the file's pages rather than for the mapping, so the policy also
+// applies to mappings of the file in application address spaces.
+//
+// If MemoryFileOpts.NUMATopology is also true, the file is divided between
+// synthetic NUMA nodes, one per host node: chunk i belongs to synthetic node
+// i % len(HostNUMANodes), and is bound to host node HostNUMANodes[i %
+// len(HostNUMANodes)]. Otherwise, there's a single synthetic node and each
+// chunk is bound to all host nodes in HostNUMANodes.
+
+// NUMAPolicy is a NUMA memory policy, as set by set_mempolicy(2) or mbind(2).
+type NUMAPolicy struct {
+	// Policy and Nodemask are the policy mode and node mask.
+	Policy   linux.NumaPolicy
+	Nodemask uint64
+
+	// LocalNode is the synthetic NUMA node that local allocations are made
+	// from.
+	LocalNode int
+}
+
+// Nodes returns the mask of synthetic NUMA nodes that memory should be
+// allocated from under p, for use as AllocOpts.Nodes.
+func (p NUMAPolicy) Nodes() uint64 {
+	switch p.Policy &^ linux.MPOL_MODE_FLAGS {
+	case linux.MPOL_BIND, linux.MPOL_INTERLEAVE:
+		return p.Nodemask
+	case linux.MPOL_PREFERRED:
+		// "If nodemask specifies more than one node ID, the first node in the
+		// mask will be selected as the preferred node. If the nodemask and
+		// maxnode arguments specify the empty set, then the policy specifies
+		// "local allocation"" - set_mempolicy(2)
+		if p.Nodemask != 0 {
+			return p.Nodemask & -p.Nodemask
+		}
+		return 1 << p.LocalNode
+	default:
+		// MPOL_DEFAULT and MPOL_LOCAL allocate from the local node.
+		return 1 << p.LocalNode
+	}
+}
+
+// NUMANodes returns the number of synthetic NUMA nodes that f's memory is
+// divided between.
+func (f *MemoryFile) NUMANodes() int {
+	if !f.opts.NUMATopology || len(f.opts.HostNUMANodes) == 0 {
+		return 1
+	}
+	return len(f.opts.HostNUMANodes)
+}
+
+// NUMANodeOf returns the synthetic NUMA node containing the page at the given
+// offset.
+func (f *MemoryFile) NUMANodeOf(off uint64) int {
+	return int((off >> chunkShift) % uint64(f.NUMANodes()))
+}
+
+// bindChunks binds chunks [first, last) of the backing file to the host NUMA
+// nodes for their synthetic nodes.
+func (f *MemoryFile) bindChunks(first, last int) error {
+	if len(f.opts.HostNUMANodes) == 0 {
+		return nil
+	}
+	for chunk := first; chunk < last; chunk++ {
+		hostNodes := f.opts.HostNUMANodes
+		if f.opts.NUMATopology {
+			node := chunk % len(hostNodes)
+			hostNodes = hostNodes[node : node+1]
+		}
+		if err := mbindFile(f.file.Fd(), uint64(chunk)<<chunkShift, chunkSize, hostNodes); err != nil {
+			return fmt.Errorf("failed to bind chunk %d to host NUMA nodes %v: %w", chunk, hostNodes, err)
+		}
+	}
+	return nil
+}
+
+// findAvailableRangeOnNodes is equivalent to findAvailableRange, except that
+// the returned range is in one of the synthetic NUMA nodes in the given mask.
+// Nodes are tried in round-robin order, so that allocations that may be
+// placed on multiple nodes are interleaved between them.
+//
+// Preconditions:
+//   - f.mu must be locked.
+//   - length <= chunkSize.
+//   - nodes must include at least one node in f.
+func (f *MemoryFile) findAvailableRangeOnNodes(length, alignment, nodes uint64) (memmap.FileRange, bool) {
+	n := f.NUMANodes()
+	for i := 0; i < n; i++ {
+		node := (f.nextNUMANode + i) % n
+		if nodes&(1<<node) == 0 {
+			continue
+		}
+		f.nextNUMANode = node + 1
+		return f.findAvailableRangeOnNode(length, alignment, node), true
+	}
+	return memmap.FileRange{}, false
+}
+
+// findAvailableRangeOnNode returns an available range in the given synthetic
+// NUMA node. Like findAvailableRangeTopDown, it searches existing chunks
+// starting at the end of the file; if none of them have sufficient space, it
+// returns a range at the end of the first chunk of the node beyond the end of
+// the file.
+//
+// Preconditions: As for findAvailableRangeOnNodes.
+func (f *MemoryFile) findAvailableRangeOnNode(length, alignment uint64, node int) memmap.FileRange {
+	n := f.NUMANodes()
+	alignmentMask := alignment - 1
+	numChunks := int(f.fileSize >> chunkShift)
+	last := numChunks - 1 - ((numChunks-1-node)%n+n)%n
+	for chunk := last; chunk >= 0; chunk -= n {
+		chunkStart := uint64(chunk) << chunkShift
+		chunkEnd := chunkStart + chunkSize
+		for gap := f.usage.UpperBoundGap(chunkEnd - 1); gap.Ok() && gap.End() > chunkStart; gap = gap.PrevLargeEnoughGap(length) {
+			start, end := gap.Start(), gap.End()
+			if start < chunkStart {
+				start = chunkStart
+			}
+			if end > chunkEnd {
+				end = chunkEnd
+			}
+			if end-start < length {
+				continue
+			}
+			if allocStart := (end - length) &^ alignmentMask; allocStart >= start {
+				return memmap.FileRange{allocStart, allocStart + length}
+			}
+		}
+	}
+	chunk := numChunks + ((node-numChunks)%n+n)%n
+	allocStart := (uint64(chunk+1)<<chunkShift - length) &^ alignmentMask
+	return memmap.FileRange{allocStart, allocStart + length}
+}
+
+// NUMAUsage returns the number of bytes allocated from each of f's synthetic
+// NUMA nodes.
+func (f *MemoryFile) NUMAUsage() []uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	usage := make([]uint64, f.NUMANodes())
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.ValuePtr().refs == 0 {
+			continue
+		}
+		fr := seg.Range()
+		for start := fr.Start; start < fr.End; {
+			end := (start &^ chunkMask) + chunkSize
+			if end > fr.End {
+				end = fr.End
+			}
+			usage[f.NUMANodeOf(start)] += end - start
+			start = end
+		}
+	}
+	return usage
+}
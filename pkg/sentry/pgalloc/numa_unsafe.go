@@ -0,0 +1,64 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// mbindFile binds the pages in the given range of the shmem file represented
+// by fd to the given host NUMA nodes. The policy is stored by the file, so the
+// temporary mapping used to set it can be unmapped immediately.
+func mbindFile(fd uintptr, off, length uint64, hostNodes []int) error {
+	maxNode := 0
+	for _, node := range hostNodes {
+		if node > maxNode {
+			maxNode = node
+		}
+	}
+	mask := make([]uint64, maxNode/64+1)
+	for _, node := range hostNodes {
+		mask[node/64] |= 1 << (node % 64)
+	}
+
+	m, _, errno := unix.Syscall6(
+		unix.SYS_MMAP,
+		0,
+		uintptr(length),
+		unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_SHARED,
+		fd,
+		uintptr(off))
+	if errno != 0 {
+		return errno
+	}
+	defer unix.Syscall(unix.SYS_MUNMAP, m, uintptr(length), 0)
+	// Linux's mm/mempolicy.c:get_nodes() uses maxnode-1 as the number of
+	// bits in the mask.
+	if _, _, errno := unix.Syscall6(
+		unix.SYS_MBIND,
+		m,
+		uintptr(length),
+		uintptr(linux.MPOL_BIND),
+		uintptr(unsafe.Pointer(&mask[0])),
+		uintptr(len(mask)*64+1),
+		0); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -17,11 +17,14 @@
 //
 // Lock order:
 //
+//	pgalloc.MemoryFile.swapMu
 //	 pgalloc.MemoryFile.mu
-//		pgalloc.MemoryFile.mappingsMu
+//		pgalloc.lazyLoader.mu
+//		  pgalloc.MemoryFile.mappingsMu
 package pgalloc
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 	"os"
@@ -131,6 +134,33 @@ type MemoryFile struct {
 	usageSwapped  uint64
 	usageLast     time.Time
 
+	// allocated is the total length in bytes of all pages with a non-zero
+	// reference count. allocated is protected by mu.
+	allocated uint64
+
+	// If limit is non-zero, Allocate fails with ENOMEM rather than causing
+	// allocated to exceed limit, and invokes onLimit (in a new goroutine, if
+	// one is not already running) with the length of the failed allocation.
+	// limit and onLimit are set by SetLimit. onLimitRunning is true while an
+	// onLimit goroutine is running. All are protected by mu.
+	limit          uint64
+	onLimit        func(length uint64)
+	onLimitRunning bool
+
+	// If onPressure is non-nil, it is invoked (in a new goroutine, if one is
+	// not already running) when allocated exceeds a non-zero
+	// pressureThreshold, and when evictions are started due to host memory
+	// pressure. pressureThreshold and onPressure are set by
+	// SetPressureCallback. onPressureRunning is true while an onPressure
+	// goroutine is running. All are protected by mu.
+	pressureThreshold uint64
+	onPressure        func()
+	onPressureRunning bool
+
+	// nextNUMANode is the synthetic NUMA node that findAvailableRangeOnNodes
+	// tries first. nextNUMANode is protected by mu.
+	nextNUMANode int
+
 	// fileSize is the size of the backing memory file in bytes. fileSize is
 	// always a power-of-two multiple of chunkSize.
 	//
@@ -183,6 +213,27 @@ type MemoryFile struct {
 	// notifications used to drive eviction. stopNotifyPressure is
 	// immutable.
 	stopNotifyPressure func()
+
+	// lazy loads the contents of pages that haven't been accessed since
+	// restore from a pages file. lazy is nil if the MemoryFile wasn't restored
+	// with LoadOpts.Lazy. lazy is immutable after LoadFrom returns.
+	lazy *lazyLoader
+
+	// swap tracks the use of the swap file, and is nil if
+	// MemoryFileOpts.SwapFile wasn't set. swap is immutable.
+	swap *swapFile
+
+	// swapMu serializes reading and writing the swap file.
+	swapMu sync.Mutex
+
+	// swapped is the total length in bytes of all pages whose contents are
+	// stored in the swap file. swapped is only mutated with mu locked, but may
+	// be read without locking mu.
+	swapped atomicbitops.Uint64
+
+	// swappable is the set of SwappableMemoryUsers that may be asked to swap
+	// out memory. swappable is protected by mu.
+	swappable map[SwappableMemoryUser]struct{}
 }
 
 // MemoryFileOpts provides options to NewMemoryFile.
@@ -200,6 +251,24 @@ type MemoryFileOpts struct {
 	// obtained from the host are zero-filled, such that MemoryFile must manually
 	// zero newly-allocated pages.
 	ManualZeroing bool
+
+	// HostNUMANodes, if non-empty, is the set of host NUMA nodes that the
+	// MemoryFile's memory is bound to.
+	HostNUMANodes []int
+
+	// If NUMATopology is true, the MemoryFile's memory is divided between
+	// synthetic NUMA nodes, one for each node in HostNUMANodes, and
+	// allocations may be placed on specific synthetic nodes using
+	// AllocOpts.Nodes. NUMATopology has no effect unless HostNUMANodes is
+	// non-empty. See numa.go.
+	NUMATopology bool
+
+	// If SwapFile is not nil, the contents of allocated pages may be written
+	// out to SwapFile, rather than causing allocations to fail at the
+	// allocation limit; see MemoryFile.Swap. The size of SwapFile determines
+	// the amount of memory that may be swapped. The MemoryFile does not take
+	// ownership of SwapFile, and overwrites its contents.
+	SwapFile *os.File
 }
 
 // DelayedEvictionType is the type of MemoryFileOpts.DelayedEviction.
@@ -244,6 +313,17 @@ type usageInfo struct {
 	// (If it is false, the tracked region may or may not be committed.)
 	knownCommitted bool
 
+	// unsavable is true if the contents of the tracked region are not saved by
+	// MemoryFile.SaveTo. See MemoryFile.MarkUnsavable.
+	unsavable bool
+
+	// swapped is true if the contents of the tracked region are stored in the
+	// MemoryFile's swap file rather than in the backing file, starting at
+	// offset swapOff. swapOff is 0 if swapped is false. See
+	// MemoryFile.SwapOut.
+	swapped bool
+	swapOff uint64
+
 	refs uint64
 }
 
@@ -256,7 +336,7 @@ func (u *usageInfo) canCommit() bool {
 	// containing the decommitted page with a hugepage. However, it's
 	// consistent with our treatment of unallocated pages, which have the same
 	// property.
-	return !u.knownCommitted && u.refs != 0
+	return !u.knownCommitted && u.refs != 0 && !u.swapped
 }
 
 // An EvictableMemoryUser represents a user of MemoryFile-allocated memory that
@@ -332,6 +412,14 @@ func NewMemoryFile(file *os.File, opts MemoryFileOpts) (*MemoryFile, error) {
 		file:      file,
 		evictable: make(map[EvictableMemoryUser]*evictableMemoryUserInfo),
 	}
+	if opts.SwapFile != nil {
+		swap, err := newSwapFile(opts.SwapFile)
+		if err != nil {
+			return nil, err
+		}
+		f.swap = swap
+		f.swappable = make(map[SwappableMemoryUser]struct{})
+	}
 	f.mappings.Store(make([]uintptr, 0))
 	f.reclaimCond.L = &f.mu
 
@@ -339,6 +427,7 @@ func NewMemoryFile(file *os.File, opts MemoryFileOpts) (*MemoryFile, error) {
 		stop, err := hostmm.NotifyCurrentMemcgPressureCallback(func() {
 			f.mu.Lock()
 			startedAny := f.startEvictionsLocked()
+			f.startPressureCallbackLocked()
 			f.mu.Unlock()
 			if startedAny {
 				log.Debugf("pgalloc.MemoryFile performing evictions due to memcg pressure")
@@ -350,6 +439,15 @@ func NewMemoryFile(file *os.File, opts MemoryFileOpts) (*MemoryFile, error) {
 		f.stopNotifyPressure = stop
 	}
 
+	// Check that the host supports binding memory to the requested nodes, so
+	// that misconfiguration is reported at startup rather than on first
+	// expansion of the file.
+	if len(opts.HostNUMANodes) != 0 {
+		if err := mbindFile(file.Fd(), 0, hostarch.PageSize, opts.HostNUMANodes); err != nil {
+			return nil, fmt.Errorf("failed to bind memory to host NUMA nodes %v: %w", opts.HostNUMANodes, err)
+		}
+	}
+
 	go f.runReclaim() // S/R-SAFE: f.mu
 
 	// The Linux kernel contains an optional feature called "Integrity
@@ -404,6 +502,11 @@ func (f *MemoryFile) Destroy() {
 type AllocOpts struct {
 	Kind usage.MemoryKind
 	Dir  Direction
+
+	// Nodes, if non-zero, is a mask of synthetic NUMA nodes from which the
+	// allocation should be made. Nodes is ignored unless the MemoryFile has
+	// multiple NUMA nodes, and for allocations larger than a chunk.
+	Nodes uint64
 }
 
 // Allocate returns a range of initially-zeroed pages of the given length with
@@ -428,8 +531,27 @@ func (f *MemoryFile) Allocate(length uint64, opts AllocOpts) (memmap.FileRange,
 		alignment = hostarch.HugePageSize
 	}
 
+	// Enforce the allocation limit, if any. Swapped pages don't count towards
+	// the limit.
+	if f.limit != 0 && f.allocated-f.swapped.RacyLoad()+length > f.limit {
+		f.startEvictionsLocked()
+		if f.onLimit != nil && !f.onLimitRunning {
+			f.onLimitRunning = true
+			go f.runOnLimit(f.onLimit, length) // S/R-SAFE: f.mu is held.
+		}
+		return memmap.FileRange{}, linuxerr.ENOMEM
+	}
+
 	// Find a range in the underlying file.
-	fr, ok := f.findAvailableRange(length, alignment, opts.Dir)
+	var (
+		fr memmap.FileRange
+		ok bool
+	)
+	if nodes := opts.Nodes & (1<<f.NUMANodes() - 1); nodes != 0 && f.NUMANodes() > 1 && length <= chunkSize {
+		fr, ok = f.findAvailableRangeOnNodes(length, alignment, nodes)
+	} else {
+		fr, ok = f.findAvailableRange(length, alignment, opts.Dir)
+	}
 	if !ok {
 		return memmap.FileRange{}, linuxerr.ENOMEM
 	}
@@ -441,6 +563,9 @@ func (f *MemoryFile) Allocate(length uint64, opts AllocOpts) (memmap.FileRange,
 		if err := f.file.Truncate(newFileSize); err != nil {
 			return memmap.FileRange{}, err
 		}
+		if err := f.bindChunks(int(f.fileSize>>chunkShift), int(newFileSize>>chunkShift)); err != nil {
+			return memmap.FileRange{}, err
+		}
 		f.fileSize = newFileSize
 		f.mappingsMu.Lock()
 		oldMappings := f.mappings.Load().([]uintptr)
@@ -462,10 +587,68 @@ func (f *MemoryFile) Allocate(length uint64, opts AllocOpts) (memmap.FileRange,
 	}) {
 		panic(fmt.Sprintf("allocating %v: failed to insert into usage set:\n%v", fr, &f.usage))
 	}
+	f.allocated += length
+	if f.pressureThreshold != 0 && f.allocated-f.swapped.RacyLoad() > f.pressureThreshold {
+		f.startPressureCallbackLocked()
+	}
 
 	return fr, nil
 }
 
+// SetLimit sets the maximum number of bytes that may be allocated from f at
+// any given time. When an allocation would exceed the limit, Allocate starts
+// evictions, calls onLimit in a new goroutine (if one is not already running)
+// with the length of the failed allocation, and returns ENOMEM. A limit of 0
+// removes any existing limit.
+func (f *MemoryFile) SetLimit(limit uint64, onLimit func(length uint64)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.limit = limit
+	f.onLimit = onLimit
+}
+
+// Limit returns the limit set by SetLimit (0 if there is no limit) and the
+// number of bytes currently allocated from f, excluding swapped pages.
+func (f *MemoryFile) Limit() (limit, allocated uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.limit, f.allocated - f.swapped.RacyLoad()
+}
+
+func (f *MemoryFile) runOnLimit(onLimit func(length uint64), length uint64) {
+	onLimit(length)
+	f.mu.Lock()
+	f.onLimitRunning = false
+	f.mu.Unlock()
+}
+
+// SetPressureCallback arranges for onPressure to be called in a new goroutine
+// (if one is not already running) when more than threshold bytes are allocated
+// from f, excluding swapped pages, and when evictions are started due to host
+// memory pressure. A threshold of 0 only calls onPressure for host memory
+// pressure. A nil onPressure removes any existing callback.
+func (f *MemoryFile) SetPressureCallback(threshold uint64, onPressure func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pressureThreshold = threshold
+	f.onPressure = onPressure
+}
+
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) startPressureCallbackLocked() {
+	if f.onPressure != nil && !f.onPressureRunning {
+		f.onPressureRunning = true
+		go f.runOnPressure(f.onPressure) // S/R-SAFE: f.mu is held.
+	}
+}
+
+func (f *MemoryFile) runOnPressure(onPressure func()) {
+	onPressure()
+	f.mu.Lock()
+	f.onPressureRunning = false
+	f.mu.Unlock()
+}
+
 // findAvailableRange returns an available range in the usageSet.
 //
 // Note that scanning for available slots takes place from end first backwards,
@@ -667,6 +850,13 @@ func (f *MemoryFile) Decommit(fr memmap.FileRange) error {
 		panic(fmt.Sprintf("invalid range: %v", fr))
 	}
 
+	f.discardLazy(fr)
+	if f.swapped.Load() != 0 {
+		// Prevent a concurrent swapIn from writing the previous contents of
+		// swapped pages after they are decommitted.
+		f.swapMu.Lock()
+		defer f.swapMu.Unlock()
+	}
 	if f.opts.ManualZeroing {
 		// FALLOC_FL_PUNCH_HOLE may not zero pages if ManualZeroing is in
 		// effect.
@@ -716,6 +906,9 @@ func (f *MemoryFile) markDecommitted(fr memmap.FileRange) {
 			f.usageExpected -= amount
 			val.knownCommitted = false
 		}
+		// Decommitted pages read as zeroes, so their swapped contents are
+		// no longer needed.
+		f.discardSwapLocked(seg)
 	})
 	if gap.Ok() {
 		panic(fmt.Sprintf("Decommit(%v): attempted to decommit unallocated pages %v:\n%v", fr, gap.Range(), &f.usage))
@@ -723,6 +916,107 @@ func (f *MemoryFile) markDecommitted(fr memmap.FileRange) {
 	f.usage.MergeRange(fr)
 }
 
+// DecommitZeroPages decommits all resident pages in fr that contain only
+// zero bytes, and returns the number of bytes decommitted. Since decommitted
+// pages read as zeroes, this releases memory without changing the contents
+// of fr.
+//
+// Preconditions:
+//   - fr.Length() > 0.
+//   - The caller must ensure that pages in fr are not concurrently written.
+func (f *MemoryFile) DecommitZeroPages(fr memmap.FileRange) (uint64, error) {
+	if !fr.WellFormed() || fr.Length() == 0 || fr.Start%hostarch.PageSize != 0 || fr.End%hostarch.PageSize != 0 {
+		panic(fmt.Sprintf("invalid range: %v", fr))
+	}
+	if err := f.EnsureLoaded(fr); err != nil {
+		return 0, err
+	}
+
+	// Find zeroed pages first, and decommit them after forEachMappingSlice
+	// returns. Non-resident pages are skipped, both because there is nothing
+	// to release and because reading them would commit them.
+	var (
+		zeroFRs  []memmap.FileRange
+		buf      []byte
+		checkErr error
+	)
+	zeroPage := make([]byte, hostarch.PageSize)
+	off := fr.Start
+	err := f.forEachMappingSlice(fr, func(bs []byte) {
+		if checkErr != nil {
+			return
+		}
+		n := len(bs) / hostarch.PageSize
+		if len(buf) < n {
+			buf = make([]byte, n)
+		}
+		if err := mincore(bs, buf); err != nil {
+			checkErr = err
+			return
+		}
+		for i := 0; i < n; i++ {
+			if buf[i]&0x1 == 0 || !bytes.Equal(bs[i*hostarch.PageSize:(i+1)*hostarch.PageSize], zeroPage) {
+				continue
+			}
+			pageFR := memmap.FileRange{off + uint64(i*hostarch.PageSize), off + uint64((i+1)*hostarch.PageSize)}
+			if l := len(zeroFRs); l != 0 && zeroFRs[l-1].End == pageFR.Start {
+				zeroFRs[l-1].End = pageFR.End
+			} else {
+				zeroFRs = append(zeroFRs, pageFR)
+			}
+		}
+		off += uint64(len(bs))
+	})
+	if err == nil {
+		err = checkErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var done uint64
+	for _, zfr := range zeroFRs {
+		if err := f.Decommit(zfr); err != nil {
+			return done, err
+		}
+		done += zfr.Length()
+	}
+	return done, nil
+}
+
+// Pageout advises the host that pages in fr are unlikely to be used in the
+// near future, as for madvise(MADV_COLD) if cold is true and
+// madvise(MADV_PAGEOUT) otherwise. Unlike Decommit, Pageout preserves the
+// contents of fr; the host may reclaim the pages by moving them to swap.
+// Pageout is advisory, so host errors are ignored.
+func (f *MemoryFile) Pageout(fr memmap.FileRange, cold bool) {
+	advice := unix.MADV_PAGEOUT
+	if cold {
+		advice = unix.MADV_COLD
+	}
+	f.forEachMappingSlice(fr, func(bs []byte) {
+		unix.Madvise(bs, advice)
+	})
+}
+
+// MarkUnsavable marks all pages in fr as unsavable: their contents are not
+// written by SaveTo, and they are zero-filled after the MemoryFile is
+// restored. This is used for memory that must not be persisted, such as
+// memfd_secret(2) files. The marking is cleared once the pages are freed.
+//
+// Preconditions: All pages in fr must be allocated.
+func (f *MemoryFile) MarkUnsavable(fr memmap.FileRange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	gap := f.usage.ApplyContiguous(fr, func(seg usageIterator) {
+		seg.ValuePtr().unsavable = true
+	})
+	if gap.Ok() {
+		panic(fmt.Sprintf("MarkUnsavable(%v): attempted to mark unallocated pages %v:\n%v", fr, gap.Range(), &f.usage))
+	}
+	f.usage.MergeRange(fr)
+}
+
 // IncRef implements memmap.File.IncRef.
 func (f *MemoryFile) IncRef(fr memmap.FileRange) {
 	if !fr.WellFormed() || fr.Length() == 0 || fr.Start%hostarch.PageSize != 0 || fr.End%hostarch.PageSize != 0 {
@@ -762,6 +1056,7 @@ func (f *MemoryFile) DecRef(fr memmap.FileRange) {
 		val.refs--
 		if val.refs == 0 {
 			f.reclaim.Add(seg.Range(), reclaimSetValue{})
+			f.allocated -= seg.Range().Length()
 			freed = true
 			// Reclassify memory as System, until it's freed by the reclaim
 			// goroutine.
@@ -769,6 +1064,8 @@ func (f *MemoryFile) DecRef(fr memmap.FileRange) {
 				usage.MemoryAccounting.Move(seg.Range().Length(), usage.System, val.kind)
 			}
 			val.kind = usage.System
+			val.unsavable = false
+			f.discardSwapLocked(seg)
 		}
 	}
 	f.usage.MergeAdjacent(fr)
@@ -779,6 +1076,19 @@ func (f *MemoryFile) DecRef(fr memmap.FileRange) {
 	}
 }
 
+// ForEachRefCount calls fn(subFR, refs) for each subrange of fr in which all
+// allocated pages have the same reference count. Unallocated pages in fr are
+// skipped.
+//
+// Preconditions: fn must not call MemoryFile methods.
+func (f *MemoryFile) ForEachRefCount(fr memmap.FileRange, fn func(subFR memmap.FileRange, refs uint64)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for seg := f.usage.LowerBoundSegment(fr.Start); seg.Ok() && seg.Start() < fr.End; seg = seg.NextSegment() {
+		fn(seg.Range().Intersect(fr), seg.ValuePtr().refs)
+	}
+}
+
 // MapInternal implements memmap.File.MapInternal.
 func (f *MemoryFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (safemem.BlockSeq, error) {
 	if !fr.WellFormed() || fr.Length() == 0 {
@@ -787,6 +1097,9 @@ func (f *MemoryFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (s
 	if at.Execute {
 		return safemem.BlockSeq{}, linuxerr.EACCES
 	}
+	if err := f.EnsureLoaded(fr); err != nil {
+		return safemem.BlockSeq{}, err
+	}
 
 	chunks := ((fr.End + chunkMask) >> chunkShift) - (fr.Start >> chunkShift)
 	if chunks == 1 {
@@ -1141,6 +1454,78 @@ func (f *MemoryFile) TotalSize() uint64 {
 	return uint64(f.fileSize)
 }
 
+// MemoryFileStats is a snapshot of the state of a MemoryFile.
+type MemoryFileStats struct {
+	// FileSize is the size of the backing file in bytes.
+	FileSize uint64
+
+	// MappedBytes is the size of the host mappings of the backing file into
+	// the sentry's address space.
+	MappedBytes uint64
+
+	// Allocated is the number of allocated bytes.
+	Allocated uint64
+
+	// Pinned is the number of allocated bytes that are referenced, and thus
+	// can't be reclaimed.
+	Pinned uint64
+
+	// Reclaimable is the number of allocated bytes that are no longer
+	// referenced and are waiting to be decommitted by the reclaimer.
+	Reclaimable uint64
+
+	// Committed is the number of allocated bytes known to be committed, as of
+	// the last call to UpdateUsage.
+	Committed uint64
+
+	// DecommittedPages is the number of referenced pages that are not known to
+	// be committed, e.g. because they have been decommitted or never touched.
+	DecommittedPages uint64
+
+	// Swapped is the number of allocated bytes whose contents are stored in
+	// the swap file.
+	Swapped uint64
+}
+
+// Stats returns a snapshot of the state of f. Committed is only accurate after
+// a call to UpdateUsage.
+func (f *MemoryFile) Stats() MemoryFileStats {
+	var mappedChunks uint64
+	mappings := f.mappings.Load().([]uintptr)
+	for i := range mappings {
+		if atomic.LoadUintptr(&mappings[i]) != 0 {
+			mappedChunks++
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := MemoryFileStats{
+		FileSize:    uint64(f.fileSize),
+		MappedBytes: mappedChunks * chunkSize,
+	}
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		length := seg.Range().Length()
+		val := seg.ValuePtr()
+		stats.Allocated += length
+		if val.refs == 0 {
+			stats.Reclaimable += length
+		} else {
+			stats.Pinned += length
+			if !val.knownCommitted {
+				stats.DecommittedPages += length / hostarch.PageSize
+			}
+		}
+		if val.knownCommitted {
+			stats.Committed += length
+		}
+		if val.swapped {
+			stats.Swapped += length
+		}
+	}
+	return stats
+}
+
 // File returns the backing file.
 func (f *MemoryFile) File() *os.File {
 	return f.file
@@ -1173,6 +1558,8 @@ func (f *MemoryFile) runReclaim() {
 			break
 		}
 
+		// The contents of reclaimed pages must not be loaded later.
+		f.discardLazy(fr)
 		if f.opts.ManualZeroing {
 			// If ManualZeroing is in effect, only hugepage-aligned regions may
 			// be safely passed to decommitFile. Pages will be zeroed on
@@ -1207,6 +1594,9 @@ func (f *MemoryFile) runReclaim() {
 		f.mu.Unlock()
 		panic("findReclaimable broke out of reclaim loop, but destroyed is no longer set")
 	}
+	if f.lazy != nil {
+		f.lazy.stop()
+	}
 	f.file.Close()
 	// Ensure that any attempts to use f.file.Fd() fail instead of getting a fd
 	// that has possibly been reassigned.
@@ -1372,12 +1762,23 @@ func (usageSetFunctions) MaxKey() uint64 {
 func (usageSetFunctions) ClearValue(val *usageInfo) {
 }
 
-func (usageSetFunctions) Merge(_ memmap.FileRange, val1 usageInfo, _ memmap.FileRange, val2 usageInfo) (usageInfo, bool) {
+func (usageSetFunctions) Merge(r1 memmap.FileRange, val1 usageInfo, _ memmap.FileRange, val2 usageInfo) (usageInfo, bool) {
+	if val1.swapped && val2.swapped {
+		// Swapped contents must be contiguous in the swap file.
+		if val2.swapOff != val1.swapOff+r1.Length() {
+			return val1, false
+		}
+		val2.swapOff = val1.swapOff
+	}
 	return val1, val1 == val2
 }
 
-func (usageSetFunctions) Split(_ memmap.FileRange, val usageInfo, _ uint64) (usageInfo, usageInfo) {
-	return val, val
+func (usageSetFunctions) Split(r memmap.FileRange, val usageInfo, split uint64) (usageInfo, usageInfo) {
+	val2 := val
+	if val.swapped {
+		val2.swapOff += split - r.Start
+	}
+	return val, val2
 }
 
 // evictableRangeSetValue is the value type of evictableRangeSet.
@@ -16,9 +16,11 @@ package pgalloc
 
 import (
 	"fmt"
+	"os"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 )
 
 const (
@@ -378,3 +380,157 @@ func TestFindUnallocatedRange(t *testing.T) {
 		})
 	}
 }
+
+func TestFindAvailableRangeOnNode(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		usage    *usageSegmentDataSlices
+		fileSize int64
+		node     int
+		want     uint64
+	}{
+		{
+			name:  "Initial allocation on node 0",
+			usage: &usageSegmentDataSlices{},
+			node:  0,
+			want:  chunkSize - page,
+		},
+		{
+			name:  "Initial allocation on node 1",
+			usage: &usageSegmentDataSlices{},
+			node:  1,
+			want:  2*chunkSize - page,
+		},
+		{
+			name: "Allocation below existing allocation in node",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{chunkSize - page},
+				End:    []uint64{chunkSize},
+				Values: []usageInfo{{refs: 1}},
+			},
+			fileSize: chunkSize,
+			node:     0,
+			want:     chunkSize - 2*page,
+		},
+		{
+			name: "Allocation skips chunks of other nodes",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{chunkSize - page},
+				End:    []uint64{chunkSize},
+				Values: []usageInfo{{refs: 1}},
+			},
+			fileSize: 2 * chunkSize,
+			node:     0,
+			want:     chunkSize - 2*page,
+		},
+		{
+			name: "Allocation grows file when node is full",
+			usage: &usageSegmentDataSlices{
+				Start:  []uint64{0},
+				End:    []uint64{chunkSize},
+				Values: []usageInfo{{refs: 1}},
+			},
+			fileSize: 2 * chunkSize,
+			node:     0,
+			want:     3*chunkSize - page,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := MemoryFile{
+				opts: MemoryFileOpts{
+					HostNUMANodes: []int{0, 1},
+					NUMATopology:  true,
+				},
+				fileSize: test.fileSize,
+			}
+			if err := f.usage.ImportSortedSlices(test.usage); err != nil {
+				t.Fatalf("Failed to initialize usage from %v: %v", test.usage, err)
+			}
+			fr := f.findAvailableRangeOnNode(page, page, test.node)
+			if fr.Start != test.want || fr.End != test.want+page {
+				t.Errorf("findAvailableRangeOnNode(%v, %x, node %d): got %v, want start %x", test.usage, test.fileSize, test.node, fr, test.want)
+			}
+			if got := f.NUMANodeOf(fr.Start); got != test.node {
+				t.Errorf("NUMANodeOf(%x): got %d, want %d", fr.Start, got, test.node)
+			}
+		})
+	}
+}
+
+func TestSwapFileAlloc(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "swap")
+	if err != nil {
+		t.Fatalf("failed to create swap file: %v", err)
+	}
+	defer file.Close()
+	if err := file.Truncate(4 * page); err != nil {
+		t.Fatalf("failed to truncate swap file: %v", err)
+	}
+	s, err := newSwapFile(file)
+	if err != nil {
+		t.Fatalf("newSwapFile failed: %v", err)
+	}
+
+	for _, step := range []struct {
+		want       uint64
+		wantOff    uint64
+		wantLength uint64
+		wantOK     bool
+	}{
+		{want: 3 * page, wantOff: 0, wantLength: 3 * page, wantOK: true},
+		{want: 3 * page, wantOff: 3 * page, wantLength: page, wantOK: true},
+		{want: page, wantOK: false},
+	} {
+		off, length, ok := s.alloc(step.want)
+		if off != step.wantOff || length != step.wantLength || ok != step.wantOK {
+			t.Fatalf("alloc(%#x): got (%#x, %#x, %t), want (%#x, %#x, %t)", step.want, off, length, ok, step.wantOff, step.wantLength, step.wantOK)
+		}
+	}
+
+	s.free(page, page)
+	if off, length, ok := s.alloc(2 * page); off != page || length != page || !ok {
+		t.Errorf("alloc after free: got (%#x, %#x, %t), want (%#x, %#x, true)", off, length, ok, page, page)
+	}
+}
+
+func TestUsageSwapMerge(t *testing.T) {
+	r1 := memmap.FileRange{0, 2 * page}
+	r2 := memmap.FileRange{2 * page, 3 * page}
+	val1 := usageInfo{refs: 1, swapped: true, swapOff: 4 * page}
+	for _, test := range []struct {
+		name    string
+		val2    usageInfo
+		wantOK  bool
+		wantOff uint64
+	}{
+		{
+			name:    "contiguous",
+			val2:    usageInfo{refs: 1, swapped: true, swapOff: 6 * page},
+			wantOK:  true,
+			wantOff: 4 * page,
+		},
+		{
+			name: "discontiguous",
+			val2: usageInfo{refs: 1, swapped: true, swapOff: 0},
+		},
+		{
+			name: "not swapped",
+			val2: usageInfo{refs: 1},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := usageSetFunctions{}.Merge(r1, val1, r2, test.val2)
+			if ok != test.wantOK {
+				t.Fatalf("Merge: got ok %t, want %t", ok, test.wantOK)
+			}
+			if ok && got.swapOff != test.wantOff {
+				t.Errorf("Merge: got swapOff %#x, want %#x", got.swapOff, test.wantOff)
+			}
+		})
+	}
+
+	left, right := usageSetFunctions{}.Split(memmap.FileRange{0, 3 * page}, val1, page)
+	if left.swapOff != 4*page || right.swapOff != 5*page {
+		t.Errorf("Split: got swapOffs (%#x, %#x), want (%#x, %#x)", left.swapOff, right.swapOff, 4*page, 5*page)
+	}
+}
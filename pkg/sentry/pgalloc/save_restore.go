@@ -19,19 +19,72 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"runtime"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/state"
 	"gvisor.dev/gvisor/pkg/state/wire"
 )
 
+// SaveOpts provides options to MemoryFile.SaveTo.
+type SaveOpts struct {
+	// If PagesFile is not nil, the contents of committed pages are written to
+	// it rather than to the state stream, such that they can be loaded from it
+	// at arbitrary offsets (and possibly lazily) by MemoryFile.LoadFrom.
+	PagesFile io.Writer
+
+	// If PagesFileAt is not nil, the contents of committed pages are instead
+	// written to it at their offsets in the MemoryFile, so that its contents
+	// can be written out of order. At most one of PagesFile and PagesFileAt
+	// may be set. The resulting pages file is loaded in the same way.
+	PagesFileAt io.WriterAt
+
+	// If Precopied is not nil, pages whose contents were already written to
+	// PagesFileAt by Precopied.Copy, and haven't changed since, are not
+	// written again. Precopied requires PagesFileAt.
+	Precopied *DirtyTracker
+}
+
+// LoadOpts provides options to MemoryFile.LoadFrom.
+type LoadOpts struct {
+	// PagesFile is the pages file written by MemoryFile.SaveTo, if
+	// SaveOpts.PagesFile was set. LoadFrom takes ownership of PagesFile.
+	PagesFile *os.File
+
+	// If Lazy is true, the contents of pages in PagesFile are loaded when
+	// they are first accessed (or by a background goroutine), rather than
+	// before LoadFrom returns.
+	Lazy bool
+}
+
 // SaveTo writes f's state to the given stream.
-func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
+func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer, opts SaveOpts) error {
+	if opts.PagesFile != nil && opts.PagesFileAt != nil {
+		return fmt.Errorf("PagesFile and PagesFileAt are mutually exclusive")
+	}
+	if opts.Precopied != nil && (opts.PagesFileAt == nil || opts.Precopied.f != f) {
+		return fmt.Errorf("Precopied requires PagesFileAt and a DirtyTracker for the same MemoryFile")
+	}
+
+	// If f was itself lazily loaded, its pages must be complete before they
+	// can be saved.
+	if l := f.lazy; l != nil {
+		if err := l.loadAll(f); err != nil {
+			return err
+		}
+	}
+
+	// The swap file isn't saved, so swapped pages must be read back first.
+	if err := f.swapInAll(); err != nil {
+		return err
+	}
+
 	// Wait for reclaim.
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -86,15 +139,51 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 	if _, err := state.Save(ctx, w, &f.usage); err != nil {
 		return err
 	}
+	external := opts.PagesFile != nil || opts.PagesFileAt != nil
+	if _, err := state.Save(ctx, w, &external); err != nil {
+		return err
+	}
 
-	// Dump out committed pages.
+	if external {
+		// Save the offset of each segment's contents in the pages file, so
+		// that they can be loaded in any order.
+		var offsets []uint64
+		var off uint64
+		for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+			if !seg.Value().knownCommitted || seg.Value().unsavable {
+				continue
+			}
+			if opts.PagesFileAt != nil {
+				offsets = append(offsets, seg.Start())
+				continue
+			}
+			offsets = append(offsets, off)
+			off += seg.Range().Length()
+		}
+		if _, err := state.Save(ctx, w, &offsets); err != nil {
+			return err
+		}
+	}
+
+	// Dump out committed pages, except for those that must not be saved.
 	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
-		if !seg.Value().knownCommitted {
+		if !seg.Value().knownCommitted || seg.Value().unsavable {
 			continue
 		}
-		// Write a header to distinguish from objects.
-		if err := state.WriteHeader(w, uint64(seg.Range().Length()), false); err != nil {
-			return err
+		if opts.PagesFileAt != nil {
+			if err := f.writePagesAt(seg.Range(), opts.PagesFileAt, opts.Precopied); err != nil {
+				return err
+			}
+			continue
+		}
+		dst := io.Writer(w)
+		if external {
+			dst = opts.PagesFile
+		} else {
+			// Write a header to distinguish from objects.
+			if err := state.WriteHeader(w, uint64(seg.Range().Length()), false); err != nil {
+				return err
+			}
 		}
 		// Write out data.
 		var ioErr error
@@ -102,7 +191,7 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 			if ioErr != nil {
 				return
 			}
-			_, ioErr = w.Write(s)
+			_, ioErr = dst.Write(s)
 		})
 		if ioErr != nil {
 			return ioErr
@@ -115,8 +204,39 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 	return nil
 }
 
+// writePagesAt writes the contents of pages in fr to w at their offsets in f,
+// except for those that haven't changed since they were copied by precopied.
+func (f *MemoryFile) writePagesAt(fr memmap.FileRange, w io.WriterAt, precopied *DirtyTracker) error {
+	if precopied != nil {
+		_, err := precopied.copyRange(fr, w)
+		return err
+	}
+	off := int64(fr.Start)
+	var ioErr error
+	err := f.forEachMappingSlice(fr, func(s []byte) {
+		if ioErr != nil {
+			return
+		}
+		var n int
+		n, ioErr = w.WriteAt(s, off)
+		off += int64(n)
+	})
+	if ioErr != nil {
+		return ioErr
+	}
+	return err
+}
+
 // LoadFrom loads MemoryFile state from the given stream.
-func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
+func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader, opts LoadOpts) error {
+	pagesFile := opts.PagesFile
+	defer func() {
+		// Unless ownership was transferred to a lazyLoader.
+		if pagesFile != nil {
+			pagesFile.Close()
+		}
+	}()
+
 	// Load metadata.
 	if _, err := state.Load(ctx, r, &f.fileSize); err != nil {
 		return err
@@ -124,12 +244,59 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 	if err := f.file.Truncate(f.fileSize); err != nil {
 		return err
 	}
+	if err := f.bindChunks(0, int(f.fileSize>>chunkShift)); err != nil {
+		return err
+	}
 	newMappings := make([]uintptr, f.fileSize>>chunkShift)
 	f.mappings.Store(newMappings)
 	if _, err := state.Load(ctx, r, &f.usage); err != nil {
 		return err
 	}
 
+	// The contents of unsavable pages were not saved, so they are zero in the
+	// new file and not known to be committed.
+	f.allocated = 0
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		val := seg.ValuePtr()
+		if val.unsavable {
+			val.knownCommitted = false
+		}
+		if val.refs != 0 {
+			f.allocated += seg.Range().Length()
+		}
+	}
+
+	var external bool
+	if _, err := state.Load(ctx, r, &external); err != nil {
+		return err
+	}
+	if external != (pagesFile != nil) {
+		if external {
+			return fmt.Errorf("checkpoint requires a pages file")
+		}
+		return fmt.Errorf("checkpoint does not have a pages file")
+	}
+	if external {
+		var offsets []uint64
+		if _, err := state.Load(ctx, r, &offsets); err != nil {
+			return err
+		}
+		chunks, err := f.lazyChunks(offsets)
+		if err != nil {
+			return err
+		}
+		l := newLazyLoader(pagesFile, chunks)
+		pagesFile = nil
+		if !opts.Lazy {
+			return l.loadAll(f)
+		}
+		if !l.done() {
+			f.lazy = l
+			go l.prefetch(f) // S/R-SAFE: runs after restore
+		}
+		return nil
+	}
+
 	// Try to map committed chunks concurrently: For any given chunk, either
 	// this loop or the following one will mmap the chunk first and cache it in
 	// f.mappings for the other, but this loop is likely to run ahead of the
@@ -195,6 +362,45 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 	return nil
 }
 
+// lazyChunks returns the chunks of a pages file whose segments begin at the
+// given offsets, and updates accounting for the restored pages.
+//
+// Preconditions: f.usage has been loaded.
+func (f *MemoryFile) lazyChunks(offsets []uint64) ([]lazyChunk, error) {
+	var chunks []lazyChunk
+	i := 0
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if !seg.Value().knownCommitted {
+			continue
+		}
+		if i == len(offsets) {
+			return nil, fmt.Errorf("pages file has %d segments, expected more", len(offsets))
+		}
+		off := offsets[i]
+		i++
+		for start := seg.Start(); start < seg.End(); {
+			end := (start + lazyChunkSize) &^ (lazyChunkSize - 1)
+			if end > seg.End() {
+				end = seg.End()
+			}
+			chunks = append(chunks, lazyChunk{
+				fr:  memmap.FileRange{start, end},
+				off: off,
+			})
+			off += end - start
+			start = end
+		}
+
+		// Pages are accounted for as soon as they're restored, even if their
+		// contents haven't been loaded yet. See the equivalent in LoadFrom.
+		usage.MemoryAccounting.Inc(seg.End()-seg.Start(), seg.Value().kind)
+	}
+	if i != len(offsets) {
+		return nil, fmt.Errorf("pages file has %d segments, expected %d", len(offsets), i)
+	}
+	return chunks, nil
+}
+
 // MemoryFileProvider provides the MemoryFile method.
 //
 // This type exists to work around a save/restore defect. The only object in a
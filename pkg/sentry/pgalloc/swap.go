@@ -0,0 +1,408 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/bitmap"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+)
+
+// A SwappableMemoryUser represents a user of MemoryFile-allocated memory whose
+// pages may be written out to the MemoryFile's swap file when the MemoryFile
+// reaches its allocation limit.
+type SwappableMemoryUser interface {
+	// SwapOut requests that the SwappableMemoryUser call MemoryFile.SwapOut
+	// on up to length bytes of memory that it has not used recently, and
+	// returns the number of bytes swapped out.
+	//
+	// Since a SwappableMemoryUser can't observe every access to its memory,
+	// it may instead prepare its memory for a later call to SwapOut (e.g.
+	// by invalidating mappings of it, so that the next access is observed)
+	// and return 0; memory that is still unused by the next call to SwapOut
+	// is then considered not recently used.
+	//
+	// SwapOut is called without any MemoryFile locks held.
+	SwapOut(ctx context.Context, length uint64) uint64
+
+	// LastUsed returns the time, in nanoseconds since the Unix epoch, at which
+	// the SwappableMemoryUser last used its memory. MemoryFile.Swap prefers
+	// to swap out the memory of users that were used least recently.
+	LastUsed() int64
+}
+
+// swapFile tracks the use of a MemoryFile's swap file.
+type swapFile struct {
+	// file is the swap file. file is immutable.
+	file *os.File
+
+	// pages is the size of the swap file in pages. pages is immutable.
+	pages uint32
+
+	// used has a bit set for each page in the swap file that stores the
+	// contents of a swapped page, as well as for each bit beyond pages. used
+	// is protected by MemoryFile.mu.
+	used bitmap.Bitmap
+
+	// next is the page in the swap file at which the next search for unused
+	// pages starts. next is protected by MemoryFile.mu.
+	next uint32
+}
+
+func newSwapFile(file *os.File) (*swapFile, error) {
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(file.Fd()), &stat); err != nil {
+		return nil, fmt.Errorf("failed to stat swap file: %w", err)
+	}
+	pages := uint64(stat.Size) / hostarch.PageSize
+	if pages == 0 {
+		return nil, fmt.Errorf("swap file size %d is smaller than a page", stat.Size)
+	}
+	if pages > math.MaxUint32/2 {
+		return nil, fmt.Errorf("swap file size %d is too large", stat.Size)
+	}
+	s := &swapFile{
+		file:  file,
+		pages: uint32(pages),
+		used:  bitmap.New(uint32(pages)),
+	}
+	if size := uint32(s.used.Size()); size > s.pages {
+		s.used.FlipRange(s.pages, size)
+	}
+	return s, nil
+}
+
+// alloc marks a run of at most want unused pages in the swap file as used,
+// and returns the offset in bytes of the first page and the length in bytes
+// of the run. If there are no unused pages, alloc returns ok == false.
+func (s *swapFile) alloc(want uint64) (off, length uint64, ok bool) {
+	start, err := s.used.FirstZero(s.next)
+	if err != nil {
+		if start, err = s.used.FirstZero(0); err != nil {
+			return 0, 0, false
+		}
+	}
+	end, err := s.used.FirstOne(start)
+	if err != nil {
+		end = uint32(s.used.Size())
+	}
+	if pages := want / hostarch.PageSize; uint64(end-start) > pages {
+		end = start + uint32(pages)
+	}
+	s.used.FlipRange(start, end)
+	s.next = end
+	if s.next >= s.pages {
+		s.next = 0
+	}
+	return uint64(start) * hostarch.PageSize, uint64(end-start) * hostarch.PageSize, true
+}
+
+// free marks the given range of the swap file as unused.
+func (s *swapFile) free(off, length uint64) {
+	s.used.ClearRange(uint32(off/hostarch.PageSize), uint32((off+length)/hostarch.PageSize))
+}
+
+// swapRange is a range of a MemoryFile whose contents are stored starting at
+// off in the swap file.
+type swapRange struct {
+	fr  memmap.FileRange
+	off uint64
+}
+
+// SwapEnabled returns true if f has a swap file.
+func (f *MemoryFile) SwapEnabled() bool {
+	return f.swap != nil
+}
+
+// SwapUsage returns the size of f's swap file in bytes, and the number of
+// bytes of it that are in use. Both are 0 if f has no swap file.
+func (f *MemoryFile) SwapUsage() (total, used uint64) {
+	if f.swap == nil {
+		return 0, 0
+	}
+	return uint64(f.swap.pages) * hostarch.PageSize, f.swapped.Load()
+}
+
+// SwappedLength returns the number of bytes in fr whose contents are stored
+// in f's swap file.
+func (f *MemoryFile) SwappedLength(fr memmap.FileRange) uint64 {
+	if f.swapped.Load() == 0 {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var n uint64
+	for seg := f.usage.LowerBoundSegment(fr.Start); seg.Ok() && seg.Start() < fr.End; seg = seg.NextSegment() {
+		if seg.ValuePtr().swapped {
+			n += seg.Range().Intersect(fr).Length()
+		}
+	}
+	return n
+}
+
+// MarkSwappable allows f to request memory swapping by u.
+//
+// MarkSwappable does not copy u, so u must be a pointer or reference type.
+//
+// MarkSwappable has no effect if f has no swap file.
+func (f *MemoryFile) MarkSwappable(u SwappableMemoryUser) {
+	if f.swap == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.swappable[u] = struct{}{}
+}
+
+// MarkUnswappable informs f that u no longer uses swappable memory.
+func (f *MemoryFile) MarkUnswappable(u SwappableMemoryUser) {
+	if f.swap == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.swappable, u)
+}
+
+// Swap asks SwappableMemoryUsers, least recently used first, to swap out
+// memory until at least length bytes have been swapped out or no user is
+// able to swap out more, and returns the number of bytes swapped out.
+func (f *MemoryFile) Swap(ctx context.Context, length uint64) uint64 {
+	if f.swap == nil {
+		return 0
+	}
+	f.mu.Lock()
+	users := make([]SwappableMemoryUser, 0, len(f.swappable))
+	for u := range f.swappable {
+		users = append(users, u)
+	}
+	f.mu.Unlock()
+
+	lastUsed := make(map[SwappableMemoryUser]int64, len(users))
+	for _, u := range users {
+		lastUsed[u] = u.LastUsed()
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return lastUsed[users[i]] < lastUsed[users[j]]
+	})
+
+	// Users may only age their memory on the first pass (see
+	// SwappableMemoryUser.SwapOut), so a second pass is required to swap out
+	// memory that is still unused.
+	var done uint64
+	for pass := 0; pass < 2 && done < length; pass++ {
+		for _, u := range users {
+			done += u.SwapOut(ctx, length-done)
+			if done >= length {
+				break
+			}
+		}
+	}
+	return done
+}
+
+// SwapOut writes the contents of up to max bytes of pages in fr to f's swap
+// file and decommits them, and returns the number of bytes swapped out. The
+// contents of swapped pages are read back from the swap file before they are
+// next accessed through MapInternal or EnsureLoaded.
+//
+// Only pages with a single reference, whose contents are savable, are swapped
+// out. Pages in fr that are not allocated are skipped.
+//
+// Preconditions: The caller must ensure that pages in fr are not concurrently
+// accessed by means other than MapInternal or EnsureLoaded, e.g. by removing
+// them from all AddressSpaces and internal mappings.
+func (f *MemoryFile) SwapOut(fr memmap.FileRange, max uint64) (uint64, error) {
+	max = hostarch.PageRoundDown(max)
+	if f.swap == nil || max == 0 {
+		return 0, nil
+	}
+	if !fr.WellFormed() || fr.Length() == 0 || fr.Start%hostarch.PageSize != 0 || fr.End%hostarch.PageSize != 0 {
+		panic(fmt.Sprintf("invalid range: %v", fr))
+	}
+	if err := f.ensureLazyLoaded(fr); err != nil {
+		return 0, err
+	}
+
+	f.swapMu.Lock()
+	defer f.swapMu.Unlock()
+
+	// Mark pages as swapped before writing them out, so that they are not
+	// counted towards the allocation limit while being written.
+	f.mu.Lock()
+	var (
+		srs  []swapRange
+		done uint64
+	)
+	for seg := f.usage.LowerBoundSegment(fr.Start); seg.Ok() && seg.Start() < fr.End && done < max; seg = seg.NextSegment() {
+		val := seg.ValuePtr()
+		if val.refs != 1 || val.swapped || val.unsavable {
+			continue
+		}
+		want := seg.Range().Intersect(fr)
+		if want.Length() > max-done {
+			want.End = want.Start + (max - done)
+		}
+		off, length, ok := f.swap.alloc(want.Length())
+		if !ok {
+			break
+		}
+		want.End = want.Start + length
+		seg = f.usage.Isolate(seg, want)
+		val = seg.ValuePtr()
+		if val.knownCommitted {
+			usage.MemoryAccounting.Dec(length, val.kind)
+			f.usageExpected -= length
+			val.knownCommitted = false
+		}
+		val.swapped = true
+		val.swapOff = off
+		f.swapped.Add(length)
+		srs = append(srs, swapRange{want, off})
+		done += length
+	}
+	f.usage.MergeRange(fr)
+	f.mu.Unlock()
+
+	for i, sr := range srs {
+		off := int64(sr.off)
+		var werr error
+		err := f.forEachMappingSlice(sr.fr, func(bs []byte) {
+			if werr != nil {
+				return
+			}
+			_, werr = f.swap.file.WriteAt(bs, off)
+			off += int64(len(bs))
+		})
+		if err == nil {
+			err = werr
+		}
+		if err != nil {
+			// The contents of pages that haven't been written out are still
+			// in f.
+			f.unswap(srs[i:])
+			for _, sr := range srs[i:] {
+				done -= sr.fr.Length()
+			}
+			if done == 0 {
+				return 0, fmt.Errorf("failed to write to swap file: %w", err)
+			}
+			log.Warningf("Failed to write %v to swap file: %v", sr.fr, err)
+			return done, nil
+		}
+		if err := f.decommitFile(sr.fr); err != nil {
+			log.Warningf("Failed to decommit swapped pages %v: %v", sr.fr, err)
+			f.unswap(srs[i : i+1])
+			done -= sr.fr.Length()
+		}
+	}
+	return done, nil
+}
+
+// unswap marks the pages in srs as not swapped, after their contents failed to
+// be swapped out.
+func (f *MemoryFile) unswap(srs []swapRange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, sr := range srs {
+		for seg := f.usage.FindSegment(sr.fr.Start); seg.Ok() && seg.Start() < sr.fr.End; seg = seg.NextSegment() {
+			seg = f.usage.Isolate(seg, sr.fr)
+			f.discardSwapLocked(seg)
+		}
+		f.usage.MergeRange(sr.fr)
+	}
+}
+
+// discardSwapLocked marks the pages in seg as not swapped and frees the swap
+// file pages storing their contents.
+//
+// Preconditions: f.mu must be locked.
+func (f *MemoryFile) discardSwapLocked(seg usageIterator) {
+	val := seg.ValuePtr()
+	if !val.swapped {
+		return
+	}
+	length := seg.Range().Length()
+	f.swap.free(val.swapOff, length)
+	f.swapped.Add(^(length - 1))
+	val.swapped = false
+	val.swapOff = 0
+}
+
+// swapIn reads the contents of swapped pages in fr back from the swap file.
+func (f *MemoryFile) swapIn(fr memmap.FileRange) error {
+	if f.swapped.Load() == 0 {
+		return nil
+	}
+	end, ok := hostarch.PageRoundUp(fr.End)
+	if !ok {
+		end = hostarch.PageRoundDown(math.MaxUint64)
+	}
+	fr = memmap.FileRange{hostarch.PageRoundDown(fr.Start), end}
+
+	f.swapMu.Lock()
+	defer f.swapMu.Unlock()
+
+	f.mu.Lock()
+	var srs []swapRange
+	for seg := f.usage.LowerBoundSegment(fr.Start); seg.Ok() && seg.Start() < fr.End; seg = seg.NextSegment() {
+		if !seg.ValuePtr().swapped {
+			continue
+		}
+		seg = f.usage.Isolate(seg, fr)
+		srs = append(srs, swapRange{seg.Range(), seg.ValuePtr().swapOff})
+	}
+	f.mu.Unlock()
+	if len(srs) == 0 {
+		return nil
+	}
+
+	for _, sr := range srs {
+		off := int64(sr.off)
+		var rerr error
+		err := f.forEachMappingSlice(sr.fr, func(bs []byte) {
+			if rerr != nil {
+				return
+			}
+			_, rerr = f.swap.file.ReadAt(bs, off)
+			off += int64(len(bs))
+		})
+		if err == nil {
+			err = rerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %v from swap file: %w", sr.fr, err)
+		}
+		// The pages are now committed, and will be accounted for by the next
+		// call to UpdateUsage.
+		f.unswap([]swapRange{sr})
+	}
+	return nil
+}
+
+// swapInAll reads the contents of all swapped pages in f back from the swap
+// file.
+func (f *MemoryFile) swapInAll() error {
+	return f.swapIn(memmap.FileRange{0, hostarch.PageRoundDown(math.MaxUint64)})
+}
@@ -24,6 +24,10 @@ type contextID int
 const (
 	// CtxPlatform is a Context.Value key for a Platform.
 	CtxPlatform contextID = iota
+
+	// CtxTSC is a Context.Value key for the value of the TSC to return to
+	// emulated TSC reads, as a uint64; see EnableTSCTrapping.
+	CtxTSC
 )
 
 // FromContext returns the Platform that is used to execute ctx's application
@@ -34,3 +38,12 @@ func FromContext(ctx context.Context) Platform {
 	}
 	return nil
 }
+
+// TSCFromContext returns the value of the TSC for emulated TSC reads by ctx's
+// application code. ok is false if ctx doesn't provide a TSC.
+func TSCFromContext(ctx context.Context) (tsc uint64, ok bool) {
+	if v := ctx.Value(CtxTSC); v != nil {
+		return v.(uint64), true
+	}
+	return 0, false
+}
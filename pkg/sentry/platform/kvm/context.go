@@ -105,7 +105,11 @@ restart:
 			if platform.TryCPUIDEmulate(ctx, mm, ac) {
 				goto restart
 			}
-			// If not a valid CPUID, then the signal should be
+			// Likewise for a trapped TSC read.
+			if platform.TryTSCEmulate(ctx, mm, ac) {
+				goto restart
+			}
+			// If not a valid CPUID or TSC read, then the signal should be
 			// delivered as is and the information is filled.
 			err = platform.ErrContextSignal
 		}
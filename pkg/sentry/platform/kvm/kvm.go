@@ -131,6 +131,11 @@ func New(deviceFile *os.File) (*KVM, error) {
 	}, nil
 }
 
+// SetNumCPUs implements platform.CPUResizer.SetNumCPUs.
+func (k *KVM) SetNumCPUs(n int) {
+	k.machine.setActiveVCPUs(vCPUsForCPUs(n))
+}
+
 // SupportsAddressSpaceIO implements platform.Platform.SupportsAddressSpaceIO.
 func (*KVM) SupportsAddressSpaceIO() bool {
 	return false
@@ -20,6 +20,7 @@ package kvm
 import (
 	"gvisor.dev/gvisor/pkg/cpuid"
 	"gvisor.dev/gvisor/pkg/ring0"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
 )
 
 // userRegs represents KVM user registers.
@@ -236,6 +237,10 @@ func updateGlobalOnce(fd int) error {
 	// any virtualization APIs, there is no need to enable this feature.
 	cpuid.X86FeatureVMX.Unset(s)
 	cpuid.X86FeatureSVM.Unset(s)
+	// Trap user TSC reads if the sentry emulates them.
+	if platform.TSCTrapping() {
+		ring0.EnableTSCTrapping()
+	}
 	ring0.Init(cpuid.FeatureSet{
 		Function: s,
 	})
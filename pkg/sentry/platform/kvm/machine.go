@@ -77,6 +77,17 @@ type machine struct {
 	// maxVCPUs is the maximum number of vCPUs supported by the machine.
 	maxVCPUs int
 
+	// activeVCPUs is the number of vCPUs that may currently be used. Only
+	// vCPUs with an ID below activeVCPUs are handed out by Get.
+	//
+	// Invariant: 0 < activeVCPUs <= maxVCPUs.
+	activeVCPUs int
+
+	// parkedVCPUs are vCPUs that were removed from vCPUsByTID because
+	// activeVCPUs was reduced below their ID. They are reused if
+	// activeVCPUs is increased again.
+	parkedVCPUs []*vCPU
+
 	// maxSlots is the maximum number of memory slots supported by the machine.
 	maxSlots int
 
@@ -240,6 +251,7 @@ func newMachine(vm int) (*machine, error) {
 	// Pull the maximum vCPUs.
 	m.getMaxVCPU()
 	log.Debugf("The maximum number of vCPUs is %d.", m.maxVCPUs)
+	m.activeVCPUs = m.maxVCPUs
 	m.vCPUsByTID = make(map[uint64]*vCPU)
 	m.vCPUsByID = make([]*vCPU, m.maxVCPUs)
 	m.kernel.Init(m.maxVCPUs)
@@ -450,7 +462,7 @@ func (m *machine) Get() *vCPU {
 	tid := procid.Current()
 
 	// Check for an exact match.
-	if c := m.vCPUsByTID[tid]; c != nil {
+	if c := m.vCPUsByTID[tid]; c != nil && c.id < m.activeVCPUs {
 		c.lock()
 		m.mu.RUnlock()
 		getVCPUCounter.Increment("fast_reused")
@@ -470,7 +482,7 @@ func (m *machine) Get() *vCPU {
 	tid = procid.Current()
 
 	// Recheck for an exact match.
-	if c := m.vCPUsByTID[tid]; c != nil {
+	if c := m.vCPUsByTID[tid]; c != nil && c.id < m.activeVCPUs {
 		c.lock()
 		m.mu.Unlock()
 		getVCPUCounter.Increment("reused")
@@ -479,7 +491,7 @@ func (m *machine) Get() *vCPU {
 
 	for {
 		// Get vCPU from the m.vCPUsByID pool.
-		if m.usedVCPUs < m.maxVCPUs {
+		if m.usedVCPUs < m.activeVCPUs {
 			c := m.vCPUsByID[m.usedVCPUs]
 			m.usedVCPUs++
 			c.lock()
@@ -490,6 +502,18 @@ func (m *machine) Get() *vCPU {
 			return c
 		}
 
+		// Reuse a parked vCPU that has become active again.
+		for i, c := range m.parkedVCPUs {
+			if c.id < m.activeVCPUs && c.state.CompareAndSwap(vCPUReady, vCPUUser) {
+				m.parkedVCPUs = append(m.parkedVCPUs[:i], m.parkedVCPUs[i+1:]...)
+				m.vCPUsByTID[tid] = c
+				m.mu.Unlock()
+				c.loadSegments(tid)
+				getVCPUCounter.Increment("unused")
+				return c
+			}
+		}
+
 		// Scan for an available vCPU.
 		for origTID, c := range m.vCPUsByTID {
 			if c.state.CompareAndSwap(vCPUReady, vCPUUser) {
@@ -547,6 +571,34 @@ func (m *machine) Put(c *vCPU) {
 	m.mu.RUnlock()
 }
 
+// setActiveVCPUs limits the vCPUs handed out by Get to the first n vCPUs of
+// the machine, or to all of them if n exceeds maxVCPUs.
+//
+// vCPUs above the new limit that are in use are not preempted; they stop
+// being reused once their current users return them.
+func (m *machine) setActiveVCPUs(n int) {
+	if n < 1 {
+		n = 1
+	}
+	if n > m.maxVCPUs {
+		n = m.maxVCPUs
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for tid, c := range m.vCPUsByTID {
+		if c.id >= n {
+			delete(m.vCPUsByTID, tid)
+			m.parkedVCPUs = append(m.parkedVCPUs, c)
+		}
+	}
+	m.activeVCPUs = n
+	log.Debugf("The number of active vCPUs is %d.", m.activeVCPUs)
+
+	// Threads waiting in Get may be able to use newly activated vCPUs.
+	m.available.Broadcast()
+}
+
 // newDirtySet returns a new dirty set.
 func (m *machine) newDirtySet() *dirtySet {
 	return &dirtySet{
@@ -368,8 +368,9 @@ func (c *vCPU) SwitchToUser(switchOpts ring0.SwitchOpts, info *linux.SignalInfo)
 		info.SetAddr(switchOpts.Registers.Rip) // Include address.
 		if vector == ring0.GeneralProtectionFault {
 			// When CPUID faulting is enabled, we will generate a #GP(0) when
-			// userspace executes a CPUID instruction. This is handled above,
-			// because we need to be able to map and read user memory.
+			// userspace executes a CPUID instruction. Likewise for RDTSC when
+			// TSC trapping is enabled. This is handled above, because we need
+			// to be able to map and read user memory.
 			return hostarch.AccessType{}, tryCPUIDError{}
 		}
 		return hostarch.AccessType{}, platform.ErrContextSignal
@@ -485,12 +486,17 @@ func (m *machine) getMaxVCPU() {
 	// overcommit with factor 2 is still acceptable. We allocate a set of
 	// vCPU for each goruntime processor (P) and two sets of vCPUs to run
 	// user code.
-	rCPUs := runtime.GOMAXPROCS(0)
-	if 3*rCPUs < m.maxVCPUs {
-		m.maxVCPUs = 3 * rCPUs
+	if n := vCPUsForCPUs(runtime.GOMAXPROCS(0)); n < m.maxVCPUs {
+		m.maxVCPUs = n
 	}
 }
 
+// vCPUsForCPUs returns the number of vCPUs used to run a sandbox with n
+// CPUs. See getMaxVCPU.
+func vCPUsForCPUs(n int) int {
+	return 3 * n
+}
+
 func archPhysicalRegions(physicalRegions []physicalRegion) []physicalRegion {
 	return physicalRegions
 }
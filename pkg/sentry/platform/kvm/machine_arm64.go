@@ -217,3 +217,9 @@ func (m *machine) getMaxVCPU() {
 		}
 	}
 }
+
+// vCPUsForCPUs returns the number of vCPUs used to run a sandbox with n
+// CPUs. See getMaxVCPU.
+func vCPUsForCPUs(n int) int {
+	return n
+}
@@ -116,6 +116,14 @@ type Platform interface {
 	SyscallFilters() seccomp.SyscallRules
 }
 
+// CPUResizer is implemented by Platforms that size their resources based on
+// the number of CPUs available to the sandbox.
+type CPUResizer interface {
+	// SetNumCPUs informs the Platform that the sandbox now runs on n CPUs.
+	// n is always positive.
+	SetNumCPUs(n int)
+}
+
 // NoCPUPreemptionDetection implements Platform.DetectsCPUPreemption and
 // dependent methods for Platforms that do not support this feature.
 type NoCPUPreemptionDetection struct{}
@@ -164,6 +164,11 @@ restart:
 		goto restart
 	}
 
+	// See if this can be handled as a trapped TSC read.
+	if linux.Signal(si.Signo) == linux.SIGSEGV && platform.TryTSCEmulate(ctx, mm, ac) {
+		goto restart
+	}
+
 	// Got a page fault. Ideally, we'd get real fault type here, but ptrace
 	// doesn't expose this information. Instead, we use a simple heuristic:
 	//
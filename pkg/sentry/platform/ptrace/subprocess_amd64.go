@@ -25,6 +25,7 @@ import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/seccomp"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
 )
 
 const (
@@ -183,6 +184,19 @@ func enableCpuidFault() {
 	unix.RawSyscall6(unix.SYS_ARCH_PRCTL, linux.ARCH_SET_CPUID, 0, 0, 0, 0, 0)
 }
 
+// enableTSCFault makes RDTSC and RDTSCP raise SIGSEGV if TSC trapping is
+// enabled, so that they can be emulated; see platform.TryTSCEmulate.
+//
+// This is safe to call in an afterFork context.
+//
+//go:norace
+//go:nosplit
+func enableTSCFault() {
+	if platform.TSCTrapping() {
+		unix.RawSyscall6(unix.SYS_PRCTL, linux.PR_SET_TSC, linux.PR_TSC_SIGSEGV, 0, 0, 0, 0)
+	}
+}
+
 // appendArchSeccompRules append architecture specific seccomp rules when creating BPF program.
 // Ref attachedThread() for more detail.
 func appendArchSeccompRules(rules []seccomp.RuleSet, defaultAction linux.BPFAction) []seccomp.RuleSet {
@@ -204,6 +218,9 @@ func appendArchSeccompRules(rules []seccomp.RuleSet, defaultAction linux.BPFActi
 					unix.SYS_ARCH_PRCTL: []seccomp.Rule{
 						{seccomp.EqualTo(linux.ARCH_SET_CPUID), seccomp.EqualTo(0)},
 					},
+					unix.SYS_PRCTL: []seccomp.Rule{
+						{seccomp.EqualTo(linux.PR_SET_TSC), seccomp.EqualTo(linux.PR_TSC_SIGSEGV)},
+					},
 				},
 				Action: linux.SECCOMP_RET_ALLOW,
 			})
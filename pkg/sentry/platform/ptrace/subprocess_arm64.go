@@ -159,6 +159,12 @@ func patchSignalInfo(regs *arch.Registers, signalInfo *linux.SignalInfo) {
 func enableCpuidFault() {
 }
 
+// Noop on arm64.
+//
+//go:nosplit
+func enableTSCFault() {
+}
+
 // appendArchSeccompRules append architecture specific seccomp rules when creating BPF program.
 // Ref attachedThread() for more detail.
 func appendArchSeccompRules(rules []seccomp.RuleSet, defaultAction linux.BPFAction) []seccomp.RuleSet {
@@ -199,6 +199,10 @@ func forkStub(flags uintptr, instrs []linux.BPFInstruction) (*thread, error) {
 	// Enable cpuid-faulting.
 	enableCpuidFault()
 
+	// Enable TSC-faulting, if required. Stubs created by createStub inherit
+	// it.
+	enableTSCFault()
+
 	// Call the stub; should not return.
 	stubCall(stubStart, ppid)
 	panic("unreachable")
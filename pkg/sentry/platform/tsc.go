@@ -0,0 +1,34 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+// tscTrapping is set if reads of the TSC by application code trap, so that
+// they can be emulated with the TSC provided by the Context; see CtxTSC.
+var tscTrapping bool
+
+// EnableTSCTrapping makes application reads of the TSC trap where the platform
+// supports it, so that they are emulated with TSCFromContext.
+//
+// It must be called before the Platform is created.
+func EnableTSCTrapping() {
+	tscTrapping = true
+}
+
+// TSCTrapping returns true if EnableTSCTrapping was called.
+//
+//go:nosplit
+func TSCTrapping() bool {
+	return tscTrapping
+}
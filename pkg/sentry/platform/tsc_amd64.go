@@ -0,0 +1,81 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64
+// +build amd64
+
+package platform
+
+import (
+	"bytes"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+var (
+	// rdtscInstruction is the RDTSC instruction.
+	rdtscInstruction = []byte{0x0f, 0x31}
+
+	// rdtscpInstruction is the RDTSCP instruction.
+	rdtscpInstruction = []byte{0x0f, 0x01, 0xf9}
+)
+
+// TryTSCEmulate checks for a RDTSC or RDTSCP instruction and, if TSC trapping
+// is enabled, emulates it using the TSC from TSCFromContext.
+func TryTSCEmulate(ctx context.Context, mm MemoryManager, ac *arch.Context64) bool {
+	if !tscTrapping {
+		return false
+	}
+	tsc, ok := TSCFromContext(ctx)
+	if !ok {
+		return false
+	}
+	s := ac.StateData()
+	tasklessCtx := emulationContext{
+		taskWrapper: taskWrapper{ctx},
+	}
+	opts := usermem.IOOpts{
+		IgnorePermissions:  true,
+		AddressSpaceActive: true,
+	}
+	// RDTSC is shorter than RDTSCP, and may be at the very end of a mapping,
+	// so only read the last byte of RDTSCP if the rest matches.
+	inst := make([]byte, len(rdtscpInstruction))
+	if _, err := mm.CopyIn(&tasklessCtx, hostarch.Addr(s.Regs.Rip), inst[:len(rdtscInstruction)], opts); err != nil {
+		return false
+	}
+	switch {
+	case bytes.Equal(inst[:len(rdtscInstruction)], rdtscInstruction):
+		inst = inst[:len(rdtscInstruction)]
+	case bytes.Equal(inst[:len(rdtscInstruction)], rdtscpInstruction[:len(rdtscInstruction)]):
+		if _, err := mm.CopyIn(&tasklessCtx, hostarch.Addr(s.Regs.Rip)+hostarch.Addr(len(rdtscInstruction)), inst[len(rdtscInstruction):], opts); err != nil {
+			return false
+		}
+		if !bytes.Equal(inst, rdtscpInstruction) {
+			return false
+		}
+		// IA32_TSC_AUX holds the CPU number in Linux. As far as the
+		// emulated TSC is concerned, everything runs on CPU 0.
+		s.Regs.Rcx = 0
+	default:
+		return false
+	}
+	s.Regs.Rax = tsc & 0xffffffff
+	s.Regs.Rdx = tsc >> 32
+	s.Regs.Rip += uint64(len(inst))
+	return true
+}
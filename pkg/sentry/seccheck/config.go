@@ -41,6 +41,9 @@ type SessionConfig struct {
 	Points []PointConfig `json:"points,omitempty"`
 	// Sinks are the sinks that will process the points enabled above.
 	Sinks []SinkConfig `json:"sinks,omitempty"`
+	// ContainerIDs restricts the session to points generated in the given
+	// containers. If empty, points from all containers are processed.
+	ContainerIDs []string `json:"container_ids,omitempty"`
 }
 
 // PointConfig describes a point to be enabled in a given session.
@@ -79,7 +82,7 @@ func Create(conf *SessionConfig, force bool) error {
 		if !force {
 			return fmt.Errorf("session %q already exists", conf.Name)
 		}
-		if err := deleteLocked(conf.Name); err != nil {
+		if _, err := deleteLocked(conf.Name); err != nil {
 			return err
 		}
 		log.Infof("Trace session %q was deleted to be replaced", conf.Name)
@@ -121,6 +124,9 @@ func Create(conf *SessionConfig, force bool) error {
 		if err != nil {
 			return fmt.Errorf("creating event sink: %w", err)
 		}
+		if len(conf.ContainerIDs) > 0 {
+			sink = newContainerFilter(sink, conf.ContainerIDs)
+		}
 		state.AppendSink(sink, reqs)
 	}
 
@@ -159,23 +165,27 @@ func setupSink(config SinkConfig) (*os.File, error) {
 	return sink.Setup(config.Config)
 }
 
-// Delete deletes an existing session.
-func Delete(name string) error {
+// Delete deletes an existing session. It returns the final status of the
+// session, e.g. how many points each sink dropped.
+func Delete(name string) (SessionConfig, error) {
 	sessionsMu.Lock()
 	defer sessionsMu.Unlock()
 	return deleteLocked(name)
 }
 
 // +checklocks:sessionsMu
-func deleteLocked(name string) error {
+func deleteLocked(name string) (SessionConfig, error) {
 	session := sessions[name]
 	if session == nil {
-		return fmt.Errorf("session %q not found", name)
+		return SessionConfig{}, fmt.Errorf("session %q not found", name)
 	}
 
+	// Sinks are stopped by clearSink, get their status afterwards to account
+	// for all points that have been processed.
+	sinks := session.getSinks()
 	session.clearSink()
 	delete(sessions, name)
-	return nil
+	return sessionStatus(name, sinks), nil
 }
 
 // List lists all existing sessions.
@@ -184,16 +194,22 @@ func List(out *[]SessionConfig) {
 	defer sessionsMu.Unlock()
 
 	for name, state := range sessions {
-		// Only report session name. Consider adding rest of the fields as needed.
-		session := SessionConfig{Name: name}
-		for _, sink := range state.getSinks() {
-			session.Sinks = append(session.Sinks, SinkConfig{
-				Name:   sink.Name(),
-				Status: sink.Status(),
-			})
-		}
-		*out = append(*out, session)
+		*out = append(*out, sessionStatus(name, state.getSinks()))
+	}
+}
+
+// sessionStatus returns the configuration of a session, populated with the
+// status of its sinks.
+func sessionStatus(name string, sinks []Sink) SessionConfig {
+	// Only report session name. Consider adding rest of the fields as needed.
+	session := SessionConfig{Name: name}
+	for _, sink := range sinks {
+		session.Sinks = append(session.Sinks, SinkConfig{
+			Name:   sink.Name(),
+			Status: sink.Status(),
+		})
 	}
+	return session
 }
 
 func findPointDesc(name string) (PointDesc, error) {
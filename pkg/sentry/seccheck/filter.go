@@ -0,0 +1,124 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccheck
+
+import (
+	"google.golang.org/protobuf/proto"
+	"gvisor.dev/gvisor/pkg/context"
+	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
+)
+
+// contextID is the seccheck package's type for context.Context.Value keys.
+type contextID int
+
+const (
+	// CtxContainerID is a Context.Value key for the ID of the container that
+	// the caller belongs to.
+	CtxContainerID contextID = iota
+)
+
+// containerIDFromContext returns the ID of the container that the caller
+// belongs to, or "" if it is unknown.
+func containerIDFromContext(ctx context.Context) string {
+	if v := ctx.Value(CtxContainerID); v != nil {
+		return v.(string)
+	}
+	return ""
+}
+
+// containerFilter is a Sink that only forwards points generated in a set of
+// containers to another Sink.
+type containerFilter struct {
+	Sink
+
+	// ids is the set of containers whose points are forwarded.
+	ids map[string]struct{}
+}
+
+var _ Sink = (*containerFilter)(nil)
+
+func newContainerFilter(sink Sink, ids []string) *containerFilter {
+	f := &containerFilter{
+		Sink: sink,
+		ids:  make(map[string]struct{}, len(ids)),
+	}
+	for _, id := range ids {
+		f.ids[id] = struct{}{}
+	}
+	return f
+}
+
+func (f *containerFilter) match(id string) bool {
+	_, ok := f.ids[id]
+	return ok
+}
+
+// Clone implements Sink.Clone.
+func (f *containerFilter) Clone(ctx context.Context, fields FieldSet, info *pb.CloneInfo) error {
+	if !f.match(containerIDFromContext(ctx)) {
+		return nil
+	}
+	return f.Sink.Clone(ctx, fields, info)
+}
+
+// Execve implements Sink.Execve.
+func (f *containerFilter) Execve(ctx context.Context, fields FieldSet, info *pb.ExecveInfo) error {
+	if !f.match(containerIDFromContext(ctx)) {
+		return nil
+	}
+	return f.Sink.Execve(ctx, fields, info)
+}
+
+// ExitNotifyParent implements Sink.ExitNotifyParent.
+func (f *containerFilter) ExitNotifyParent(ctx context.Context, fields FieldSet, info *pb.ExitNotifyParentInfo) error {
+	if !f.match(containerIDFromContext(ctx)) {
+		return nil
+	}
+	return f.Sink.ExitNotifyParent(ctx, fields, info)
+}
+
+// TaskExit implements Sink.TaskExit.
+func (f *containerFilter) TaskExit(ctx context.Context, fields FieldSet, info *pb.TaskExit) error {
+	if !f.match(containerIDFromContext(ctx)) {
+		return nil
+	}
+	return f.Sink.TaskExit(ctx, fields, info)
+}
+
+// ContainerStart implements Sink.ContainerStart.
+func (f *containerFilter) ContainerStart(ctx context.Context, fields FieldSet, info *pb.Start) error {
+	// The container is started from outside of it, so use the ID of the
+	// container being started.
+	if !f.match(info.Id) {
+		return nil
+	}
+	return f.Sink.ContainerStart(ctx, fields, info)
+}
+
+// Syscall implements Sink.Syscall.
+func (f *containerFilter) Syscall(ctx context.Context, fields FieldSet, ctxData *pb.ContextData, msgType pb.MessageType, msg proto.Message) error {
+	if !f.match(containerIDFromContext(ctx)) {
+		return nil
+	}
+	return f.Sink.Syscall(ctx, fields, ctxData, msgType, msg)
+}
+
+// RawSyscall implements Sink.RawSyscall.
+func (f *containerFilter) RawSyscall(ctx context.Context, fields FieldSet, info *pb.Syscall) error {
+	if !f.match(containerIDFromContext(ctx)) {
+		return nil
+	}
+	return f.Sink.RawSyscall(ctx, fields, info)
+}
@@ -261,3 +261,40 @@ func TestFieldMask(t *testing.T) {
 		t.Errorf("FieldMask must not contain %v: %+v", want, fd)
 	}
 }
+
+// containerContext is a context.Context that belongs to a container.
+type containerContext struct {
+	context.Context
+	id string
+}
+
+// Value implements context.Context.Value.
+func (c *containerContext) Value(key interface{}) interface{} {
+	if key == CtxContainerID {
+		return c.id
+	}
+	return c.Context.Value(key)
+}
+
+func TestContainerFilter(t *testing.T) {
+	var got []string
+	sink := &testSink{
+		onClone: func(ctx context.Context, fields FieldSet, info *pb.CloneInfo) error {
+			got = append(got, containerIDFromContext(ctx))
+			return nil
+		},
+	}
+	filter := newContainerFilter(sink, []string{"a", "b"})
+	for _, id := range []string{"a", "b", "c", ""} {
+		ctx := &containerContext{Context: context.Background(), id: id}
+		if err := filter.Clone(ctx, FieldSet{}, &pb.CloneInfo{}); err != nil {
+			t.Errorf("Clone(%q): %v", id, err)
+		}
+	}
+	if want := []string{"a", "b"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("points forwarded from containers: got %v, want %v", got, want)
+	}
+	if want, got := sink.Name(), filter.Name(); want != got {
+		t.Errorf("filter.Name(): got %q, want %q", got, want)
+	}
+}
@@ -74,7 +74,29 @@ func setupSink(config map[string]interface{}) (*os.File, error) {
 	if !ok {
 		return nil, fmt.Errorf("endpoint %q is not a string", addrOpaque)
 	}
-	return setup(addr)
+	sndbuf := 0
+	if sndbufOpaque, ok := config["send_buffer_size"]; ok {
+		size, ok := sndbufOpaque.(float64)
+		if !ok || size <= 0 || float64(int(size)) != size {
+			return nil, fmt.Errorf("send_buffer_size %v is not a positive int", sndbufOpaque)
+		}
+		sndbuf = int(size)
+	}
+
+	f, err := setup(addr)
+	if err != nil {
+		return nil, err
+	}
+	if sndbuf > 0 {
+		// The send buffer caps the amount of points in flight to the remote
+		// process. Points that don't fit are dropped and accounted for in the
+		// dropped count.
+		if err := unix.SetsockoptInt(int(f.Fd()), unix.SOL_SOCKET, unix.SO_SNDBUF, sndbuf); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("setsockopt(SO_SNDBUF, %d): %w", sndbuf, err)
+		}
+	}
+	return f, nil
 }
 
 func setup(path string) (*os.File, error) {
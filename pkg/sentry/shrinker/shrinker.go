@@ -0,0 +1,231 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shrinker shrinks discardable sentry caches under memory pressure.
+//
+// Caches register with Register. When the sandbox approaches its memory limit,
+// or the host signals memory pressure, the kernel calls Shrink, which asks the
+// registered caches to evict their least recently used objects until enough
+// memory has been freed.
+package shrinker
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Kinds of caches. Caches are reported by kind in metrics and Usage.
+const (
+	// Dentries is the kind of caches of unreferenced dentries.
+	Dentries = "dentries"
+
+	// NegativeDentries is the kind of caches of failed lookups.
+	NegativeDentries = "negative_dentries"
+
+	// FilePages is the kind of caches of file data.
+	FilePages = "file_pages"
+)
+
+// kinds are all kinds of caches, in the order in which Usage reports them.
+var kinds = []string{Dentries, NegativeDentries, FilePages}
+
+// Cache is a cache whose contents can be discarded to free memory.
+type Cache interface {
+	// Usage returns the number of objects in the cache, and the approximate
+	// number of bytes of memory that they use.
+	Usage() (objects, bytes uint64)
+
+	// Shrink evicts objects from the cache, least recently used first, until
+	// the cache uses at most target bytes or nothing more can be evicted. It
+	// returns the number of objects evicted.
+	//
+	// Shrink is called without any locks held.
+	Shrink(ctx context.Context, target uint64) uint64
+}
+
+var (
+	cacheField = metric.NewField("cache", kinds)
+
+	// evictions is the number of objects evicted by Shrink, by kind of
+	// cache.
+	evictions = metric.MustCreateNewUint64Metric("/fs/cache/evictions", false /* sync */, "Number of objects evicted from sentry caches under memory pressure, by kind of cache.", cacheField)
+)
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/fs/cache/objects", false /* cumulative */, false /* sync */, "Number of objects in sentry caches, by kind of cache.", func(fields ...string) uint64 {
+		objects, _ := usageOf(fields[0])
+		return objects
+	}, cacheField)
+	metric.MustRegisterCustomUint64Metric("/fs/cache/bytes", false /* cumulative */, false /* sync */, "Approximate memory used by sentry caches in bytes, by kind of cache.", func(fields ...string) uint64 {
+		_, bytes := usageOf(fields[0])
+		return bytes
+	}, cacheField)
+}
+
+// registration is a registered Cache.
+type registration struct {
+	kind  string
+	cache Cache
+}
+
+var (
+	// mu protects caches.
+	mu sync.Mutex
+
+	// caches are the registered caches, in registration order.
+	caches []*registration
+
+	// shrinkMu serializes Shrink.
+	shrinkMu sync.Mutex
+)
+
+// Register registers c as a cache of the given kind, which must be one of the
+// kinds defined by this package. It returns a function that unregisters c.
+func Register(kind string, c Cache) (unregister func()) {
+	r := &registration{kind: kind, cache: c}
+	mu.Lock()
+	caches = append(caches, r)
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, other := range caches {
+			if other == r {
+				caches = append(caches[:i], caches[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// registered returns a copy of caches.
+func registered() []*registration {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]*registration(nil), caches...)
+}
+
+// usageOf returns the total usage of caches of the given kind.
+func usageOf(kind string) (objects, bytes uint64) {
+	for _, r := range registered() {
+		if r.kind == kind {
+			o, b := r.cache.Usage()
+			objects += o
+			bytes += b
+		}
+	}
+	return objects, bytes
+}
+
+// TotalBytes returns the approximate memory used by all registered caches in
+// bytes.
+func TotalBytes() uint64 {
+	var total uint64
+	for _, r := range registered() {
+		_, b := r.cache.Usage()
+		total += b
+	}
+	return total
+}
+
+// Shrink asks the registered caches to free want bytes in total, each in
+// proportion to the memory that it uses, and returns the number of bytes
+// actually freed.
+func Shrink(ctx context.Context, want uint64) uint64 {
+	shrinkMu.Lock()
+	defer shrinkMu.Unlock()
+
+	rs := registered()
+	usages := make([]uint64, len(rs))
+	var total uint64
+	for i, r := range rs {
+		_, usages[i] = r.cache.Usage()
+		total += usages[i]
+	}
+	if total == 0 || want == 0 {
+		return 0
+	}
+	if want > total {
+		want = total
+	}
+	var freed uint64
+	for i, r := range rs {
+		if usages[i] == 0 {
+			continue
+		}
+		// Ask every cache for some progress, even if its share rounds
+		// down to nothing.
+		share := uint64(float64(want)*float64(usages[i])/float64(total) + 0.5)
+		if share == 0 {
+			share = 1
+		}
+		if share > usages[i] {
+			share = usages[i]
+		}
+		if n := r.cache.Shrink(ctx, usages[i]-share); n != 0 {
+			evictions.IncrementBy(n, r.kind)
+		}
+		if _, after := r.cache.Usage(); after < usages[i] {
+			freed += usages[i] - after
+		}
+	}
+	return freed
+}
+
+// RecordEvictions records that n objects were evicted from a cache of the
+// given kind other than by Shrink, e.g. to enforce a cache's own size limit.
+func RecordEvictions(kind string, n uint64) {
+	evictions.IncrementBy(n, kind)
+}
+
+// CacheUsage is the usage of the caches of a kind.
+type CacheUsage struct {
+	// Kind is the kind of caches.
+	Kind string `json:"Kind"`
+
+	// Caches is the number of registered caches of this kind.
+	Caches int `json:"Caches"`
+
+	// Objects is the number of objects in the caches.
+	Objects uint64 `json:"Objects"`
+
+	// Bytes is the approximate memory used by the caches in bytes.
+	Bytes uint64 `json:"Bytes"`
+
+	// Evictions is the number of objects evicted from the caches by Shrink.
+	Evictions uint64 `json:"Evictions"`
+}
+
+// Usage returns the usage of the registered caches, by kind.
+func Usage() []CacheUsage {
+	us := make([]CacheUsage, len(kinds))
+	for i, kind := range kinds {
+		us[i] = CacheUsage{
+			Kind:      kind,
+			Evictions: evictions.Value(kind),
+		}
+	}
+	for _, r := range registered() {
+		for i := range us {
+			if us[i].Kind == r.kind {
+				o, b := r.cache.Usage()
+				us[i].Caches++
+				us[i].Objects += o
+				us[i].Bytes += b
+			}
+		}
+	}
+	return us
+}
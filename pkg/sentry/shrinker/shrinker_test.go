@@ -0,0 +1,97 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shrinker
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/context"
+)
+
+// testCache is a Cache of objects of objectSize bytes each.
+type testCache struct {
+	objects    uint64
+	objectSize uint64
+	pinned     uint64
+}
+
+// Usage implements Cache.Usage.
+func (c *testCache) Usage() (uint64, uint64) {
+	return c.objects, c.objects * c.objectSize
+}
+
+// Shrink implements Cache.Shrink.
+func (c *testCache) Shrink(ctx context.Context, target uint64) uint64 {
+	var n uint64
+	for c.objects > c.pinned && c.objects*c.objectSize > target {
+		c.objects--
+		n++
+	}
+	return n
+}
+
+func TestShrinkProportional(t *testing.T) {
+	a := &testCache{objects: 300, objectSize: 10}
+	b := &testCache{objects: 100, objectSize: 10}
+	defer Register(Dentries, a)()
+	defer Register(FilePages, b)()
+
+	before := Usage()
+	if freed := Shrink(context.Background(), 2000); freed != 2000 {
+		t.Errorf("Shrink freed %d bytes, want 2000", freed)
+	}
+	if a.objects != 150 || b.objects != 50 {
+		t.Errorf("got %d and %d objects left, want 150 and 50", a.objects, b.objects)
+	}
+	after := Usage()
+	for i, u := range after {
+		want := before[i].Evictions
+		switch u.Kind {
+		case Dentries:
+			want += 150
+		case FilePages:
+			want += 50
+		}
+		if u.Evictions != want {
+			t.Errorf("%s evictions: got %d, want %d", u.Kind, u.Evictions, want)
+		}
+	}
+}
+
+func TestShrinkPinned(t *testing.T) {
+	c := &testCache{objects: 10, objectSize: 100, pinned: 8}
+	defer Register(NegativeDentries, c)()
+
+	if freed := Shrink(context.Background(), 1000); freed != 200 {
+		t.Errorf("Shrink freed %d bytes, want 200", freed)
+	}
+	if got := TotalBytes(); got != 800 {
+		t.Errorf("TotalBytes: got %d, want 800", got)
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	c := &testCache{objects: 10, objectSize: 100}
+	unregister := Register(Dentries, c)
+	unregister()
+	if freed := Shrink(context.Background(), 1000); freed != 0 {
+		t.Errorf("Shrink freed %d bytes from an unregistered cache", freed)
+	}
+	for _, u := range Usage() {
+		if u.Caches != 0 || u.Objects != 0 {
+			t.Errorf("%s: got %d caches with %d objects, want none", u.Kind, u.Caches, u.Objects)
+		}
+	}
+}
@@ -312,6 +312,20 @@ func PackTimestamp(t *kernel.Task, timestamp time.Time, buf []byte) []byte {
 	)
 }
 
+// PackTimestamping packs a SCM_TIMESTAMPING socket control message with the
+// given software timestamp.
+func PackTimestamping(t *kernel.Task, timestamp time.Time, buf []byte) []byte {
+	var ts linux.ControlMessageTimestamping
+	ts.Ts[0] = linux.NsecToTimespec(timestamp.UnixNano())
+	return putCmsgStruct(
+		buf,
+		linux.SOL_SOCKET,
+		linux.SCM_TIMESTAMPING,
+		t.Arch().Width(),
+		&ts,
+	)
+}
+
 // PackInq packs a TCP_INQ socket control message.
 func PackInq(t *kernel.Task, inq int32, buf []byte) []byte {
 	return putCmsgStruct(
@@ -418,6 +432,28 @@ func PackSockExtendedErr(t *kernel.Task, sockErr linux.SockErrCMsg, buf []byte)
 	)
 }
 
+// PackUDPGRO packs a UDP_GRO socket control message.
+func PackUDPGRO(t *kernel.Task, groSize uint16, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_UDP,
+		linux.UDP_GRO,
+		t.Arch().Width(),
+		primitive.AllocateInt32(int32(groSize)),
+	)
+}
+
+// PackSCTPSndRcv packs an SCTP_SNDRCV socket control message.
+func PackSCTPSndRcv(t *kernel.Task, info *linux.SCTPSndRcvInfo, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_SCTP,
+		linux.SCTP_SNDRCV,
+		t.Arch().Width(),
+		info,
+	)
+}
+
 // PackControlMessages packs control messages into the given buffer.
 //
 // We skip control messages specific to Unix domain sockets.
@@ -425,10 +461,19 @@ func PackSockExtendedErr(t *kernel.Task, sockErr linux.SockErrCMsg, buf []byte)
 // Note that some control messages may be truncated if they do not fit under
 // the capacity of buf.
 func PackControlMessages(t *kernel.Task, cmsgs socket.ControlMessages, buf []byte) []byte {
+	if cmsgs.IP.HasGROSize {
+		// In Linux, UDP_GRO is added before SO_TIMESTAMP.
+		buf = PackUDPGRO(t, cmsgs.IP.GROSize, buf)
+	}
+
 	if cmsgs.IP.HasTimestamp {
 		buf = PackTimestamp(t, cmsgs.IP.Timestamp, buf)
 	}
 
+	if cmsgs.IP.HasTimestamping {
+		buf = PackTimestamping(t, cmsgs.IP.Timestamp, buf)
+	}
+
 	if cmsgs.IP.HasInq {
 		// In Linux, TCP_CM_INQ is added after SO_TIMESTAMP.
 		buf = PackInq(t, cmsgs.IP.Inq, buf)
@@ -466,6 +511,10 @@ func PackControlMessages(t *kernel.Task, cmsgs socket.ControlMessages, buf []byt
 		buf = PackSockExtendedErr(t, cmsgs.IP.SockErr, buf)
 	}
 
+	if cmsgs.IP.HasSCTPSndRcvInfo {
+		buf = PackSCTPSndRcv(t, &cmsgs.IP.SCTPSndRcvInfo, buf)
+	}
+
 	return buf
 }
 
@@ -479,10 +528,18 @@ func cmsgSpace(t *kernel.Task, dataLen int) int {
 func CmsgsSpace(t *kernel.Task, cmsgs socket.ControlMessages) int {
 	space := 0
 
+	if cmsgs.IP.HasGROSize {
+		space += cmsgSpace(t, linux.SizeOfControlMessageUDPGRO)
+	}
+
 	if cmsgs.IP.HasTimestamp {
 		space += cmsgSpace(t, linux.SizeOfTimeval)
 	}
 
+	if cmsgs.IP.HasTimestamping {
+		space += cmsgSpace(t, linux.SizeOfControlMessageTimestamping)
+	}
+
 	if cmsgs.IP.HasInq {
 		space += cmsgSpace(t, linux.SizeOfControlMessageInq)
 	}
@@ -519,6 +576,10 @@ func CmsgsSpace(t *kernel.Task, cmsgs socket.ControlMessages) int {
 		space += cmsgSpace(t, cmsgs.IP.SockErr.SizeBytes())
 	}
 
+	if cmsgs.IP.HasSCTPSndRcvInfo {
+		space += cmsgSpace(t, linux.SizeOfSCTPSndRcvInfo)
+	}
+
 	return space
 }
 
@@ -694,6 +755,39 @@ func Parse(t *kernel.Task, socketOrEndpoint interface{}, buf []byte, width uint)
 				errCmsg.UnmarshalBytes(buf)
 				cmsgs.IP.SockErr = &errCmsg
 
+			default:
+				return socket.ControlMessages{}, linuxerr.EINVAL
+			}
+		case linux.SOL_UDP:
+			switch h.Type {
+			case linux.UDP_SEGMENT:
+				if length != linux.SizeOfControlMessageUDPSegment {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				var gsoSize primitive.Uint16
+				gsoSize.UnmarshalUnsafe(buf)
+				cmsgs.IP.HasGSOSize = true
+				cmsgs.IP.GSOSize = uint16(gsoSize)
+
+			default:
+				return socket.ControlMessages{}, linuxerr.EINVAL
+			}
+		case linux.SOL_SCTP:
+			switch h.Type {
+			case linux.SCTP_SNDRCV:
+				var info linux.SCTPSndRcvInfo
+				if length < info.SizeBytes() {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				info.UnmarshalUnsafe(buf)
+				// Multi-homing and partial reliability are not
+				// supported.
+				if info.Flags&linux.SCTP_ADDR_OVER != 0 || info.TimeToLive != 0 {
+					return socket.ControlMessages{}, linuxerr.EOPNOTSUPP
+				}
+				cmsgs.IP.HasSCTPSndRcvInfo = true
+				cmsgs.IP.SCTPSndRcvInfo = info
+
 			default:
 				return socket.ControlMessages{}, linuxerr.EINVAL
 			}
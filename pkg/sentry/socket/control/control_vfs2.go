@@ -90,6 +90,29 @@ func (fs *RightsFilesVFS2) Release(ctx context.Context) {
 	*fs = nil
 }
 
+// hostFDFile is implemented by file description implementations that are
+// backed by a host FD which may be passed to host peers.
+type hostFDFile interface {
+	HostFD() (int, error)
+}
+
+// HostFDs implements transport.HostRightsControlMessage.HostFDs.
+func (fs *RightsFilesVFS2) HostFDs() ([]int, bool) {
+	fds := make([]int, 0, len(*fs))
+	for _, f := range *fs {
+		hf, ok := f.Impl().(hostFDFile)
+		if !ok {
+			return nil, false
+		}
+		fd, err := hf.HostFD()
+		if err != nil {
+			return nil, false
+		}
+		fds = append(fds, fd)
+	}
+	return fds, true
+}
+
 // rightsFDsVFS2 gets up to the specified maximum number of FDs.
 func rightsFDsVFS2(t *kernel.Task, rights SCMRightsVFS2, cloexec bool, max int) ([]int32, bool) {
 	files, trunc := rights.Files(t, max)
@@ -672,6 +672,10 @@ func parseUnixControlMessages(unixControlMessages []unix.SocketControlMessage) s
 
 // SendMsg implements socket.Socket.SendMsg.
 func (s *socketOpsCommon) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags int, haveDeadline bool, deadline ktime.Time, controlMessages socket.ControlMessages) (int, *syserr.Error) {
+	// SO_ZEROCOPY can't be set on host sockets, so MSG_ZEROCOPY is ignored as
+	// in Linux.
+	flags &^= unix.MSG_ZEROCOPY
+
 	// Only allow known and safe flags.
 	if flags&^(unix.MSG_DONTWAIT|unix.MSG_EOR|unix.MSG_FASTOPEN|unix.MSG_MORE|unix.MSG_NOSIGNAL) != 0 {
 		return 0, syserr.ErrInvalidArgument
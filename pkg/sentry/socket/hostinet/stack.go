@@ -50,6 +50,9 @@ var defaultSendBufSize = inet.TCPBufferSize{
 	Max:     4194304,
 }
 
+// defaultTCPRetries2 is the default value of Linux's net.ipv4.tcp_retries2.
+const defaultTCPRetries2 = 15
+
 // Stack implements inet.Stack for host sockets.
 type Stack struct {
 	// Stack is immutable.
@@ -61,6 +64,7 @@ type Stack struct {
 	tcpRecvBufSize inet.TCPBufferSize
 	tcpSendBufSize inet.TCPBufferSize
 	tcpSACKEnabled bool
+	tcpRetries2    uint32
 	netDevFile     *os.File
 	netSNMPFile    *os.File
 }
@@ -114,6 +118,15 @@ func (s *Stack) Configure() error {
 		log.Warningf("Failed to read if TCP SACK if enabled, setting to true")
 	}
 
+	s.tcpRetries2 = defaultTCPRetries2
+	if retries, err := ioutil.ReadFile("/proc/sys/net/ipv4/tcp_retries2"); err == nil {
+		if v, err := strconv.ParseUint(strings.TrimSpace(string(retries)), 10, 32); err == nil {
+			s.tcpRetries2 = uint32(v)
+		}
+	} else {
+		log.Warningf("Failed to read TCP retries2, using default value")
+	}
+
 	if f, err := os.Open("/proc/net/dev"); err != nil {
 		log.Warningf("Failed to open /proc/net/dev: %v", err)
 	} else {
@@ -325,6 +338,11 @@ func (*Stack) RemoveInterface(int32) error {
 	return linuxerr.EACCES
 }
 
+// SetInterfaceUp implements inet.Stack.SetInterfaceUp.
+func (*Stack) SetInterfaceUp(int32, bool) error {
+	return linuxerr.EACCES
+}
+
 // InterfaceAddrs implements inet.Stack.InterfaceAddrs.
 func (s *Stack) InterfaceAddrs() map[int32][]inet.InterfaceAddr {
 	addrs := make(map[int32][]inet.InterfaceAddr)
@@ -389,6 +407,16 @@ func (*Stack) SetTCPRecovery(inet.TCPLossRecovery) error {
 	return linuxerr.EACCES
 }
 
+// TCPRetries2 implements inet.Stack.TCPRetries2.
+func (s *Stack) TCPRetries2() (uint32, error) {
+	return s.tcpRetries2, nil
+}
+
+// SetTCPRetries2 implements inet.Stack.SetTCPRetries2.
+func (*Stack) SetTCPRetries2(uint32) error {
+	return linuxerr.EACCES
+}
+
 // getLine reads one line from proc file, with specified prefix.
 // The last argument, withHeader, specifies if it contains line header.
 func getLine(f *os.File, prefix string, withHeader bool) string {
@@ -485,6 +513,16 @@ func (s *Stack) RouteTable() []inet.Route {
 	return append([]inet.Route(nil), s.routes...)
 }
 
+// AddRoute implements inet.Stack.AddRoute.
+func (*Stack) AddRoute(inet.Route, uint16) error {
+	return linuxerr.EACCES
+}
+
+// RemoveRoute implements inet.Stack.RemoveRoute.
+func (*Stack) RemoveRoute(inet.Route) error {
+	return linuxerr.EACCES
+}
+
 // Pause implements inet.Stack.Pause.
 func (*Stack) Pause() {}
 
@@ -515,3 +553,29 @@ func (*Stack) PortRange() (uint16, uint16) {
 func (*Stack) SetPortRange(uint16, uint16) error {
 	return linuxerr.EACCES
 }
+
+// ConnTrackTimeouts implements inet.Stack.ConnTrackTimeouts. Connections
+// are tracked by the host, so they are not visible to the sandbox.
+func (*Stack) ConnTrackTimeouts() (stack.ConnTrackTimeouts, error) {
+	return stack.ConnTrackTimeouts{}, linuxerr.EOPNOTSUPP
+}
+
+// SetConnTrackTimeouts implements inet.Stack.SetConnTrackTimeouts.
+func (*Stack) SetConnTrackTimeouts(stack.ConnTrackTimeouts) error {
+	return linuxerr.EOPNOTSUPP
+}
+
+// ConnTrackMax implements inet.Stack.ConnTrackMax.
+func (*Stack) ConnTrackMax() (int, error) {
+	return 0, linuxerr.EOPNOTSUPP
+}
+
+// SetConnTrackMax implements inet.Stack.SetConnTrackMax.
+func (*Stack) SetConnTrackMax(int) error {
+	return linuxerr.EOPNOTSUPP
+}
+
+// ConnTrackCount implements inet.Stack.ConnTrackCount.
+func (*Stack) ConnTrackCount() (int, error) {
+	return 0, linuxerr.EOPNOTSUPP
+}
@@ -30,12 +30,15 @@ type matchMaker interface {
 	// name is the matcher name as stored in the xt_entry_match struct.
 	name() string
 
+	// revision is the highest supported revision of the matcher.
+	revision() uint8
+
 	// marshal converts from a stack.Matcher to an ABI struct.
 	marshal(matcher matcher) []byte
 
 	// unmarshal converts from the ABI matcher struct to an
 	// stack.Matcher.
-	unmarshal(task *kernel.Task, buf []byte, filter stack.IPHeaderFilter) (stack.Matcher, error)
+	unmarshal(task *kernel.Task, stk *stack.Stack, buf []byte, filter stack.IPHeaderFilter) (stack.Matcher, error)
 }
 
 type matcher interface {
@@ -55,6 +58,16 @@ func registerMatchMaker(mm matchMaker) {
 	matchMakers[mm.name()] = mm
 }
 
+func matchRevision(name string, rev uint8) (uint8, bool) {
+	matchMaker, ok := matchMakers[name]
+	if !ok || rev > matchMaker.revision() {
+		return 0, false
+	}
+
+	// Return the highest supported revision.
+	return matchMaker.revision(), true
+}
+
 func marshalMatcher(mr stack.Matcher) []byte {
 	matcher := mr.(matcher)
 	matchMaker, ok := matchMakers[matcher.name()]
@@ -67,6 +80,12 @@ func marshalMatcher(mr stack.Matcher) []byte {
 // marshalEntryMatch creates a marshalled XTEntryMatch with the given name and
 // data appended at the end.
 func marshalEntryMatch(name string, data []byte) []byte {
+	return marshalEntryMatchRevision(name, 0 /* revision */, data)
+}
+
+// marshalEntryMatchRevision is like marshalEntryMatch, but for matchers with
+// multiple revisions.
+func marshalEntryMatchRevision(name string, revision uint8, data []byte) []byte {
 	nflog("marshaling matcher %q", name)
 
 	// We have to pad this struct size to a multiple of 8 bytes.
@@ -74,6 +93,7 @@ func marshalEntryMatch(name string, data []byte) []byte {
 	matcher := linux.KernelXTEntryMatch{
 		XTEntryMatch: linux.XTEntryMatch{
 			MatchSize: uint16(size),
+			Revision:  revision,
 		},
 		Data: data,
 	}
@@ -85,12 +105,12 @@ func marshalEntryMatch(name string, data []byte) []byte {
 	return buf
 }
 
-func unmarshalMatcher(task *kernel.Task, match linux.XTEntryMatch, filter stack.IPHeaderFilter, buf []byte) (stack.Matcher, error) {
+func unmarshalMatcher(task *kernel.Task, stk *stack.Stack, match linux.XTEntryMatch, filter stack.IPHeaderFilter, buf []byte) (stack.Matcher, error) {
 	matchMaker, ok := matchMakers[match.Name.String()]
 	if !ok {
 		return nil, fmt.Errorf("unsupported matcher with name %q", match.Name.String())
 	}
-	return matchMaker.unmarshal(task, buf, filter)
+	return matchMaker.unmarshal(task, stk, buf, filter)
 }
 
 // targetMaker knows how to (un)marshal a target. Once registered,
@@ -49,8 +49,13 @@ func convertNetstackToBinary4(stk *stack.Stack, tablename linux.TableName) (linu
 		return linux.KernelIPTGetEntries{}, linux.IPTGetinfo{}, fmt.Errorf("couldn't find table %q", tablename)
 	}
 
+	table := stk.IPTables().GetTable(id, false)
+	if !isLegacyTable(table) {
+		return linux.KernelIPTGetEntries{}, linux.IPTGetinfo{}, fmt.Errorf("table %q is managed by nftables", tablename)
+	}
+
 	// Setup the info struct.
-	entries, info := getEntries4(stk.IPTables().GetTable(id, false), tablename)
+	entries, info := getEntries4(table, tablename)
 	return entries, info, nil
 }
 
@@ -162,7 +167,7 @@ func modifyEntries4(task *kernel.Task, stk *stack.Stack, optVal []byte, replace
 			nflog("entry doesn't have enough room for its matchers (only %d bytes remain)", len(optVal))
 			return nil, syserr.ErrInvalidArgument
 		}
-		matchers, err := parseMatchers(task, filter, optVal[:matchersSize])
+		matchers, err := parseMatchers(task, stk, filter, optVal[:matchersSize])
 		if err != nil {
 			nflog("failed to parse matchers: %v", err)
 			return nil, syserr.ErrInvalidArgument
@@ -49,8 +49,13 @@ func convertNetstackToBinary6(stk *stack.Stack, tablename linux.TableName) (linu
 		return linux.KernelIP6TGetEntries{}, linux.IPTGetinfo{}, fmt.Errorf("couldn't find table %q", tablename)
 	}
 
+	table := stk.IPTables().GetTable(id, true)
+	if !isLegacyTable(table) {
+		return linux.KernelIP6TGetEntries{}, linux.IPTGetinfo{}, fmt.Errorf("table %q is managed by nftables", tablename)
+	}
+
 	// Setup the info struct, which is the same in IPv4 and IPv6.
-	entries, info := getEntries6(stk.IPTables().GetTable(id, true), tablename)
+	entries, info := getEntries6(table, tablename)
 	return entries, info, nil
 }
 
@@ -165,7 +170,7 @@ func modifyEntries6(task *kernel.Task, stk *stack.Stack, optVal []byte, replace
 			nflog("entry doesn't have enough room for its matchers (only %d bytes remain)", len(optVal))
 			return nil, syserr.ErrInvalidArgument
 		}
-		matchers, err := parseMatchers(task, filter, optVal[:matchersSize])
+		matchers, err := parseMatchers(task, stk, filter, optVal[:matchersSize])
 		if err != nil {
 			nflog("failed to parse matchers: %v", err)
 			return nil, syserr.ErrInvalidArgument
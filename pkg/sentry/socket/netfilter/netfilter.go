@@ -82,6 +82,22 @@ func DefaultLinuxTables(clock tcpip.Clock, rand *rand.Rand) *stack.IPTables {
 	return tables
 }
 
+// isLegacyTable returns whether table was set via iptables(8) rather than
+// nftables, i.e. whether all its matchers and targets can be marshalled.
+func isLegacyTable(table stack.Table) bool {
+	for _, rule := range table.Rules {
+		if _, ok := rule.Target.(target); !ok {
+			return false
+		}
+		for _, m := range rule.Matchers {
+			if _, ok := m.(matcher); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // GetInfo returns information about iptables.
 func GetInfo(t *kernel.Task, stack *stack.Stack, outPtr hostarch.Addr, ipv6 bool) (linux.IPTGetinfo, *syserr.Error) {
 	// Read in the struct and table name.
@@ -185,6 +201,8 @@ func SetEntries(task *kernel.Task, stk *stack.Stack, optVal []byte, ipv6 bool) *
 		table = stack.EmptyFilterTable()
 	case natTable:
 		table = stack.EmptyNATTable()
+	case mangleTable:
+		table = stack.EmptyMangleTable()
 	default:
 		nflog("unknown iptables table %q", replace.Name.String())
 		return syserr.ErrInvalidArgument
@@ -270,6 +288,18 @@ func SetEntries(task *kernel.Task, stk *stack.Stack, optVal []byte, ipv6 bool) *
 		table.Rules[ruleIdx] = rule
 	}
 
+	// As in net/netfilter/xt_TPROXY.c, the TPROXY target may only be used in
+	// the mangle table's PREROUTING chain and the user chains it jumps to.
+	for ruleIdx, hooks := range ruleHooks(table) {
+		if _, ok := table.Rules[ruleIdx].Target.(*tproxyTarget); !ok {
+			continue
+		}
+		if replace.Name.String() != mangleTable || hooks&^(1<<stack.Prerouting) != 0 {
+			nflog("TPROXY target is only valid in the mangle table's PREROUTING chain")
+			return syserr.ErrInvalidArgument
+		}
+	}
+
 	// Since we don't support FORWARD, yet, make sure all other chains point to
 	// ACCEPT rules.
 	for hook, ruleIdx := range table.BuiltinChains {
@@ -293,9 +323,41 @@ func SetEntries(task *kernel.Task, stk *stack.Stack, optVal []byte, ipv6 bool) *
 	return nil
 }
 
+// ruleHooks returns, for each rule in table, the set of hooks whose builtin
+// chains may reach it, as in
+// net/ipv4/netfilter/ip_tables.c:mark_source_chains. Jumps are assumed to
+// be taken, and chains to end at their underflow or at the next user chain.
+func ruleHooks(table stack.Table) []uint32 {
+	hooks := make([]uint32, len(table.Rules))
+	var visit func(ruleIdx int, hook stack.Hook)
+	visit = func(ruleIdx int, hook stack.Hook) {
+		for ; ruleIdx < len(table.Rules); ruleIdx++ {
+			if hooks[ruleIdx]&(1<<hook) != 0 {
+				return
+			}
+			hooks[ruleIdx] |= 1 << hook
+			if ruleIdx == table.Underflows[hook] {
+				return
+			}
+			switch target := table.Rules[ruleIdx].Target.(type) {
+			case *JumpTarget:
+				visit(target.RuleNum, hook)
+			case *userChainTarget, *errorTarget:
+				return
+			}
+		}
+	}
+	for hook, ruleIdx := range table.BuiltinChains {
+		if ruleIdx != stack.HookUnset {
+			visit(ruleIdx, stack.Hook(hook))
+		}
+	}
+	return hooks
+}
+
 // parseMatchers parses 0 or more matchers from optVal. optVal should contain
 // only the matchers.
-func parseMatchers(task *kernel.Task, filter stack.IPHeaderFilter, optVal []byte) ([]stack.Matcher, error) {
+func parseMatchers(task *kernel.Task, stk *stack.Stack, filter stack.IPHeaderFilter, optVal []byte) ([]stack.Matcher, error) {
 	nflog("set entries: parsing matchers of size %d", len(optVal))
 	var matchers []stack.Matcher
 	for len(optVal) > 0 {
@@ -318,7 +380,7 @@ func parseMatchers(task *kernel.Task, filter stack.IPHeaderFilter, optVal []byte
 		}
 
 		// Parse the specific matcher.
-		matcher, err := unmarshalMatcher(task, match, filter, optVal[linux.SizeOfXTEntryMatch:match.MatchSize])
+		matcher, err := unmarshalMatcher(task, stk, match, filter, optVal[linux.SizeOfXTEntryMatch:match.MatchSize])
 		if err != nil {
 			return nil, fmt.Errorf("failed to create matcher: %v", err)
 		}
@@ -391,6 +453,23 @@ func TargetRevision(t *kernel.Task, revPtr hostarch.Addr, netProto tcpip.Network
 	return rev, nil
 }
 
+// MatchRevision returns a linux.XTGetRevision for a given matcher. It sets
+// Revision to the highest supported value, unless the provided revision number
+// is larger.
+func MatchRevision(t *kernel.Task, revPtr hostarch.Addr) (linux.XTGetRevision, *syserr.Error) {
+	// Read in the matcher name and version.
+	var rev linux.XTGetRevision
+	if _, err := rev.CopyIn(t, revPtr); err != nil {
+		return linux.XTGetRevision{}, syserr.FromError(err)
+	}
+	maxSupported, ok := matchRevision(rev.Name.String(), rev.Revision)
+	if !ok {
+		return linux.XTGetRevision{}, syserr.ErrProtocolNotSupported
+	}
+	rev.Revision = maxSupported
+	return rev, nil
+}
+
 func trimNullBytes(b []byte) []byte {
 	n := bytes.IndexByte(b, 0)
 	if n == -1 {
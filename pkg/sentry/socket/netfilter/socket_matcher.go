@@ -0,0 +1,147 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const matcherNameSocket = "socket"
+
+func init() {
+	registerMatchMaker(socketMarshaler{})
+}
+
+// socketMarshaler implements matchMaker for socket matching.
+type socketMarshaler struct{}
+
+// name implements matchMaker.name.
+func (socketMarshaler) name() string {
+	return matcherNameSocket
+}
+
+// revision implements matchMaker.revision.
+func (socketMarshaler) revision() uint8 {
+	return 2
+}
+
+// marshal implements matchMaker.marshal.
+func (socketMarshaler) marshal(mr matcher) []byte {
+	matcher := mr.(*SocketMatcher)
+	if matcher.revision == 0 {
+		return marshalEntryMatch(matcherNameSocket, nil)
+	}
+	info := linux.XTSocketMatchInfo{
+		Flags: matcher.flags,
+	}
+	return marshalEntryMatchRevision(matcherNameSocket, matcher.revision, marshal.Marshal(&info))
+}
+
+// unmarshal implements matchMaker.unmarshal.
+func (socketMarshaler) unmarshal(_ *kernel.Task, stk *stack.Stack, buf []byte, filter stack.IPHeaderFilter) (stack.Matcher, error) {
+	// Revision 0 has no data.
+	if len(buf) < linux.SizeOfXTSocketMatchInfo {
+		return &SocketMatcher{stack: stk}, nil
+	}
+
+	// For alignment reasons, the match's total size may
+	// exceed what's strictly necessary to hold matchData.
+	var matchData linux.XTSocketMatchInfo
+	matchData.UnmarshalUnsafe(buf)
+	nflog("parseMatchers: parsed XTSocketMatchInfo: %+v", matchData)
+
+	if matchData.Flags&^(linux.XT_SOCKET_TRANSPARENT|linux.XT_SOCKET_NOWILDCARD) != 0 {
+		return nil, fmt.Errorf("unsupported socket matcher flags set: %#x", matchData.Flags)
+	}
+
+	// Use the lowest revision that supports the flags.
+	revision := uint8(1)
+	if matchData.Flags&linux.XT_SOCKET_NOWILDCARD != 0 {
+		revision = 2
+	}
+	return &SocketMatcher{
+		stack:    stk,
+		flags:    matchData.Flags,
+		revision: revision,
+	}, nil
+}
+
+// SocketMatcher matches packets that belong to a local TCP or UDP socket, as
+// for packets of connections accepted by transparent sockets. It implements
+// Matcher.
+//
+// In Linux, such packets are usually marked and then delivered locally by
+// policy routing; netstack delivers any packets that match locally.
+type SocketMatcher struct {
+	stack    *stack.Stack
+	flags    uint8
+	revision uint8
+}
+
+// name implements matcher.name.
+func (*SocketMatcher) name() string {
+	return matcherNameSocket
+}
+
+// Match implements Matcher.Match.
+func (sm *SocketMatcher) Match(hook stack.Hook, pkt stack.PacketBufferPtr, _, _ string) (bool, bool) {
+	// Support only for PREROUTING and INPUT chains.
+	if hook != stack.Prerouting && hook != stack.Input {
+		return false, false
+	}
+
+	var id stack.TransportEndpointID
+	transportHeader := pkt.TransportHeader().Slice()
+	switch pkt.TransportProtocolNumber {
+	case header.TCPProtocolNumber:
+		if len(transportHeader) < header.TCPMinimumSize {
+			return false, false
+		}
+		tcp := header.TCP(transportHeader)
+		id.LocalPort = tcp.DestinationPort()
+		id.RemotePort = tcp.SourcePort()
+	case header.UDPProtocolNumber:
+		if len(transportHeader) < header.UDPMinimumSize {
+			return false, false
+		}
+		udp := header.UDP(transportHeader)
+		id.LocalPort = udp.DestinationPort()
+		id.RemotePort = udp.SourcePort()
+	default:
+		return false, false
+	}
+	netHeader := pkt.Network()
+	id.LocalAddress = netHeader.DestinationAddress()
+	id.RemoteAddress = netHeader.SourceAddress()
+
+	// As in Linux, sockets bound to the wildcard address are ignored unless
+	// XT_SOCKET_NOWILDCARD is set.
+	wildcard := sm.flags&linux.XT_SOCKET_NOWILDCARD != 0
+	ep, transparent := sm.stack.FindSocket(pkt.NetworkProtocolNumber, pkt.TransportProtocolNumber, id, pkt.NICID, wildcard)
+	if ep == nil {
+		return false, false
+	}
+	if sm.flags&linux.XT_SOCKET_TRANSPARENT != 0 && !transparent {
+		return false, false
+	}
+	pkt.SetDeliverLocally()
+	return true, false
+}
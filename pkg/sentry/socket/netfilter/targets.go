@@ -41,6 +41,15 @@ const RedirectTargetName = "REDIRECT"
 // and/or IP for packets.
 const SNATTargetName = "SNAT"
 
+// TPROXYTargetName is used to mark targets as TPROXY targets. TPROXY targets
+// should be reached for only the mangle table's PREROUTING chain. These
+// targets divert packets to local transparent sockets without changing them.
+const TPROXYTargetName = "TPROXY"
+
+// MarkTargetName is used to mark targets as MARK targets. These targets
+// change the packet's mark.
+const MarkTargetName = "MARK"
+
 func init() {
 	// Standard targets include ACCEPT, DROP, RETURN, and JUMP.
 	registerTargetMaker(&standardTargetMaker{
@@ -72,6 +81,23 @@ func init() {
 	registerTargetMaker(&snatTargetMakerV6{
 		NetworkProtocol: header.IPv6ProtocolNumber,
 	})
+
+	registerTargetMaker(&tproxyTargetMakerV0{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&tproxyTargetMakerV1{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&tproxyTargetMakerV1{
+		NetworkProtocol: header.IPv6ProtocolNumber,
+	})
+
+	registerTargetMaker(&markTargetMaker{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&markTargetMaker{
+		NetworkProtocol: header.IPv6ProtocolNumber,
+	})
 }
 
 // The stack package provides some basic, useful targets for us. The following
@@ -155,6 +181,37 @@ func (st *snatTarget) id() targetID {
 	}
 }
 
+type tproxyTarget struct {
+	stack.TPROXYTarget
+
+	// revision is the revision of the target set by userspace, which
+	// determines how it is marshalled.
+	revision uint8
+}
+
+func (tt *tproxyTarget) id() targetID {
+	return targetID{
+		name:            TPROXYTargetName,
+		networkProtocol: tt.NetworkProtocol,
+		revision:        tt.revision,
+	}
+}
+
+type markTarget struct {
+	stack.MarkTarget
+
+	// NetworkProtocol is the network protocol the target is used with.
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (mt *markTarget) id() targetID {
+	return targetID{
+		name:            MarkTargetName,
+		networkProtocol: mt.NetworkProtocol,
+		revision:        2,
+	}
+}
+
 type standardTargetMaker struct {
 	NetworkProtocol tcpip.NetworkProtocolNumber
 }
@@ -582,6 +639,202 @@ func (*snatTargetMakerV6) unmarshal(buf []byte, filter stack.IPHeaderFilter) (ta
 	return &target, nil
 }
 
+// +marshal
+type xtTPROXYTarget struct {
+	Target linux.XTEntryTarget
+	Info   linux.XTTPROXYTargetInfo
+}
+
+const xtTPROXYTargetMarshalledSize = linux.SizeOfXTEntryTarget + linux.SizeOfXTTPROXYTargetInfo
+
+type tproxyTargetMakerV0 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (tm *tproxyTargetMakerV0) id() targetID {
+	return targetID{
+		name:            TPROXYTargetName,
+		networkProtocol: tm.NetworkProtocol,
+	}
+}
+
+func (*tproxyTargetMakerV0) marshal(target target) []byte {
+	tt := target.(*tproxyTarget)
+	xt := xtTPROXYTarget{
+		Target: linux.XTEntryTarget{
+			TargetSize: xtTPROXYTargetMarshalledSize,
+		},
+		Info: linux.XTTPROXYTargetInfo{
+			MarkMask:  tt.MarkMask,
+			MarkValue: tt.Mark,
+			LocalPort: htons(tt.Port),
+		},
+	}
+	copy(xt.Target.Name[:], TPROXYTargetName)
+	copy(xt.Info.LocalAddr[:], tt.Addr)
+	return marshal.Marshal(&xt)
+}
+
+func (*tproxyTargetMakerV0) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if size := xtTPROXYTargetMarshalledSize; len(buf) < size {
+		nflog("tproxyTargetMakerV0: buf has insufficient size (%d) for TPROXY target (%d)", len(buf), size)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	if p := filter.Protocol; p != header.TCPProtocolNumber && p != header.UDPProtocolNumber {
+		nflog("tproxyTargetMakerV0: bad proto %d", p)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var info linux.XTTPROXYTargetInfo
+	info.UnmarshalUnsafe(buf[linux.SizeOfXTEntryTarget:])
+
+	target := tproxyTarget{
+		TPROXYTarget: stack.TPROXYTarget{
+			Mark:            info.MarkValue,
+			MarkMask:        info.MarkMask,
+			Port:            ntohs(info.LocalPort),
+			NetworkProtocol: filter.NetworkProtocol(),
+		},
+	}
+	if addr := tcpip.Address(info.LocalAddr[:]); addr != header.IPv4Any {
+		target.Addr = addr
+	}
+
+	return &target, nil
+}
+
+// +marshal
+type xtTPROXYTargetV1 struct {
+	Target linux.XTEntryTarget
+	Info   linux.XTTPROXYTargetInfoV1
+	_      [4]byte
+}
+
+const xtTPROXYTargetV1MarshalledSize = linux.SizeOfXTEntryTarget + linux.SizeOfXTTPROXYTargetInfoV1 + 4
+
+type tproxyTargetMakerV1 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (tm *tproxyTargetMakerV1) id() targetID {
+	return targetID{
+		name:            TPROXYTargetName,
+		networkProtocol: tm.NetworkProtocol,
+		revision:        1,
+	}
+}
+
+func (*tproxyTargetMakerV1) marshal(target target) []byte {
+	tt := target.(*tproxyTarget)
+	xt := xtTPROXYTargetV1{
+		Target: linux.XTEntryTarget{
+			TargetSize: xtTPROXYTargetV1MarshalledSize,
+			Revision:   1,
+		},
+		Info: linux.XTTPROXYTargetInfoV1{
+			MarkMask:  tt.MarkMask,
+			MarkValue: tt.Mark,
+			LocalPort: htons(tt.Port),
+		},
+	}
+	copy(xt.Target.Name[:], TPROXYTargetName)
+	copy(xt.Info.LocalAddr[:], tt.Addr)
+	return marshal.Marshal(&xt)
+}
+
+func (*tproxyTargetMakerV1) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if size := xtTPROXYTargetV1MarshalledSize; len(buf) < size {
+		nflog("tproxyTargetMakerV1: buf has insufficient size (%d) for TPROXY target (%d)", len(buf), size)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	if p := filter.Protocol; p != header.TCPProtocolNumber && p != header.UDPProtocolNumber {
+		nflog("tproxyTargetMakerV1: bad proto %d", p)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var info linux.XTTPROXYTargetInfoV1
+	info.UnmarshalUnsafe(buf[linux.SizeOfXTEntryTarget:])
+
+	netProto := filter.NetworkProtocol()
+	target := tproxyTarget{
+		TPROXYTarget: stack.TPROXYTarget{
+			Mark:            info.MarkValue,
+			MarkMask:        info.MarkMask,
+			Port:            ntohs(info.LocalPort),
+			NetworkProtocol: netProto,
+		},
+		revision: 1,
+	}
+	switch netProto {
+	case header.IPv4ProtocolNumber:
+		if addr := tcpip.Address(info.LocalAddr[:header.IPv4AddressSize]); addr != header.IPv4Any {
+			target.Addr = addr
+		}
+	case header.IPv6ProtocolNumber:
+		if addr := tcpip.Address(info.LocalAddr[:]); addr != header.IPv6Any {
+			target.Addr = addr
+		}
+	}
+
+	return &target, nil
+}
+
+// +marshal
+type xtMarkTarget struct {
+	Target linux.XTEntryTarget
+	Info   linux.XTMarkTargetInfoV2
+}
+
+const xtMarkTargetMarshalledSize = linux.SizeOfXTEntryTarget + linux.SizeOfXTMarkTargetInfoV2
+
+type markTargetMaker struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (mm *markTargetMaker) id() targetID {
+	return targetID{
+		name:            MarkTargetName,
+		networkProtocol: mm.NetworkProtocol,
+		revision:        2,
+	}
+}
+
+func (*markTargetMaker) marshal(target target) []byte {
+	mt := target.(*markTarget)
+	xt := xtMarkTarget{
+		Target: linux.XTEntryTarget{
+			TargetSize: xtMarkTargetMarshalledSize,
+			Revision:   2,
+		},
+		Info: linux.XTMarkTargetInfoV2{
+			Mark: mt.Mark,
+			Mask: mt.Mask,
+		},
+	}
+	copy(xt.Target.Name[:], MarkTargetName)
+	return marshal.Marshal(&xt)
+}
+
+func (*markTargetMaker) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if size := xtMarkTargetMarshalledSize; len(buf) < size {
+		nflog("markTargetMaker: buf has insufficient size (%d) for MARK target (%d)", len(buf), size)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var info linux.XTMarkTargetInfoV2
+	info.UnmarshalUnsafe(buf[linux.SizeOfXTEntryTarget:])
+
+	return &markTarget{
+		MarkTarget: stack.MarkTarget{
+			Mark: info.Mark,
+			Mask: info.Mask,
+		},
+		NetworkProtocol: filter.NetworkProtocol(),
+	}, nil
+}
+
 // translateToStandardTarget translates from the value in a
 // linux.XTStandardTarget to an stack.Verdict.
 func translateToStandardTarget(val int32, netProto tcpip.NetworkProtocolNumber) (target, *syserr.Error) {
@@ -0,0 +1,114 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netlink
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// maxGroups is the number of multicast groups supported per protocol. Only
+// the groups that fit in sockaddr_nl.nl_groups are supported.
+const maxGroups = 32
+
+// multicastMembers tracks the sockets that are members of at least one
+// multicast group.
+//
+// multicastMembers is rebuilt by socketOpsCommon.afterLoad on restore.
+var multicastMembers struct {
+	// mu protects sockets.
+	//
+	// Lock ordering: socketOpsCommon.mu may be held when taking mu.
+	mu sync.Mutex
+
+	// sockets maps netlink protocols to the member sockets of that protocol.
+	sockets map[int]map[*socketOpsCommon]struct{}
+}
+
+// setGroupsLocked sets the multicast groups that s is a member of to the
+// bitmask groups, where bit N-1 represents group N.
+//
+// Preconditions: s.mu is held.
+func (s *socketOpsCommon) setGroupsLocked(groups uint32) {
+	s.groups.Store(groups)
+	s.updateMembership()
+}
+
+// updateMembership adds s to or removes it from multicastMembers according to
+// s.groups.
+func (s *socketOpsCommon) updateMembership() {
+	multicastMembers.mu.Lock()
+	defer multicastMembers.mu.Unlock()
+
+	protocol := s.protocol.Protocol()
+	if s.groups.Load() == 0 {
+		delete(multicastMembers.sockets[protocol], s)
+		return
+	}
+	if multicastMembers.sockets == nil {
+		multicastMembers.sockets = make(map[int]map[*socketOpsCommon]struct{})
+	}
+	members, ok := multicastMembers.sockets[protocol]
+	if !ok {
+		members = make(map[*socketOpsCommon]struct{})
+		multicastMembers.sockets[protocol] = members
+	}
+	members[s] = struct{}{}
+}
+
+// afterLoad is invoked by stateify.
+func (s *socketOpsCommon) afterLoad() {
+	if s.groups.Load() != 0 {
+		s.updateMembership()
+	}
+}
+
+// SendMulticast sends m to all sockets of the given protocol in the network
+// namespace of stack that are members of the multicast group group. Like
+// Linux, m is dropped for member sockets whose receive buffer is full.
+func SendMulticast(ctx context.Context, stack inet.Stack, protocol int, group uint32, m *Message) {
+	if group == 0 || group > maxGroups {
+		return
+	}
+	mask := uint32(1) << (group - 1)
+
+	buf := m.Finalize()
+	cms := transport.ControlMessages{
+		Credentials: kernelCreds,
+	}
+
+	// Sockets remove themselves from multicastMembers before releasing their
+	// connection, so holding mu keeps the connections valid.
+	multicastMembers.mu.Lock()
+	defer multicastMembers.mu.Unlock()
+	for s := range multicastMembers.sockets[protocol] {
+		if s.groups.Load()&mask == 0 || s.netns == nil || s.netns.Stack() != stack {
+			continue
+		}
+		// RecvMsg never receives the address, so we don't need to send
+		// one.
+		_, notify, err := s.connection.Send(ctx, [][]byte{buf}, cms, tcpip.FullAddress{})
+		if err != nil && err != syserr.ErrWouldBlock {
+			continue
+		}
+		if notify {
+			s.connection.SendNotify()
+		}
+	}
+}
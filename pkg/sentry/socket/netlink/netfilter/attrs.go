@@ -0,0 +1,159 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bits"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// attr is a netlink attribute.
+type attr struct {
+	typ   uint16
+	value []byte
+}
+
+// parseAttrList parses the netlink attributes in b, in order. Flags are
+// stripped from attribute types.
+func parseAttrList(b []byte) ([]attr, *syserr.Error) {
+	var list []attr
+	for len(b) >= linux.NetlinkAttrHeaderSize {
+		var hdr linux.NetlinkAttrHeader
+		hdr.UnmarshalUnsafe(b)
+		l := int(hdr.Length)
+		if l < linux.NetlinkAttrHeaderSize || l > len(b) {
+			return nil, syserr.ErrInvalidArgument
+		}
+		list = append(list, attr{
+			typ:   hdr.Type & linux.NLA_TYPE_MASK,
+			value: b[linux.NetlinkAttrHeaderSize:l],
+		})
+		// Linux permits the last attribute not being aligned.
+		l = bits.AlignUp(l, linux.NLA_ALIGNTO)
+		if l > len(b) {
+			l = len(b)
+		}
+		b = b[l:]
+	}
+	return list, nil
+}
+
+// attrs maps attribute types to attribute values.
+type attrs map[uint16][]byte
+
+// parseAttrs parses the netlink attributes in b. If an attribute type is
+// repeated, the last one wins, as in Linux.
+func parseAttrs(b []byte) (attrs, *syserr.Error) {
+	list, err := parseAttrList(b)
+	if err != nil {
+		return nil, err
+	}
+	a := make(attrs, len(list))
+	for _, at := range list {
+		a[at.typ] = at.value
+	}
+	return a, nil
+}
+
+// has returns whether a contains an attribute of type typ.
+func (a attrs) has(typ uint16) bool {
+	_, ok := a[typ]
+	return ok
+}
+
+// string returns the value of the NUL-terminated string attribute typ.
+func (a attrs) string(typ uint16) (string, bool) {
+	v, ok := a[typ]
+	if !ok {
+		return "", false
+	}
+	for i, c := range v {
+		if c == 0 {
+			v = v[:i]
+			break
+		}
+	}
+	return string(v), true
+}
+
+// uint32 returns the value of the big-endian 32-bit attribute typ.
+func (a attrs) uint32(typ uint16) (uint32, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(v), true
+}
+
+// uint64 returns the value of the big-endian 64-bit attribute typ.
+func (a attrs) uint64(typ uint16) (uint64, bool) {
+	v, ok := a[typ]
+	if !ok || len(v) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(v), true
+}
+
+// nested parses the value of the nested attribute typ.
+func (a attrs) nested(typ uint16) (attrs, bool, *syserr.Error) {
+	v, ok := a[typ]
+	if !ok {
+		return nil, false, nil
+	}
+	n, err := parseAttrs(v)
+	return n, true, err
+}
+
+// attrBuilder builds a sequence of netlink attributes.
+type attrBuilder []byte
+
+// put adds an attribute with the given type and value.
+func (b *attrBuilder) put(typ uint16, value []byte) {
+	l := linux.NetlinkAttrHeaderSize + len(value)
+	var hdr [linux.NetlinkAttrHeaderSize]byte
+	hostarch.ByteOrder.PutUint16(hdr[0:], uint16(l))
+	hostarch.ByteOrder.PutUint16(hdr[2:], typ)
+	*b = append(*b, hdr[:]...)
+	*b = append(*b, value...)
+	*b = append(*b, make([]byte, bits.AlignUp(l, linux.NLA_ALIGNTO)-l)...)
+}
+
+// putString adds a NUL-terminated string attribute.
+func (b *attrBuilder) putString(typ uint16, s string) {
+	b.put(typ, append([]byte(s), 0))
+}
+
+// putUint32 adds a big-endian 32-bit attribute.
+func (b *attrBuilder) putUint32(typ uint16, v uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	b.put(typ, buf[:])
+}
+
+// putUint64 adds a big-endian 64-bit attribute.
+func (b *attrBuilder) putUint64(typ uint16, v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	b.put(typ, buf[:])
+}
+
+// putNested adds a nested attribute containing the attributes in nested.
+func (b *attrBuilder) putNested(typ uint16, nested attrBuilder) {
+	b.put(typ|linux.NLA_F_NESTED, nested)
+}
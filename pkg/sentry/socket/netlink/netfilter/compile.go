@@ -0,0 +1,360 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// The ruleset is compiled into netstack's iptables tables. Each base chain
+// is compiled into the netstack table that is checked at its hook: nat
+// chains into the nat table, filter chains into the filter table, or the
+// mangle table at hooks that the filter table isn't checked at, and route
+// chains into the mangle table. In each netstack table, the base chains of a
+// hook are laid out in priority order, each followed by a rule applying its
+// policy, and then the regular chains each of them may jump to, each
+// followed by a return rule. Since netstack's jumps are calls, accepting a
+// packet in a base chain jumps to the next base chain of the hook, and
+// chains that are reachable from several base chains are compiled once per
+// base chain.
+
+// stackTable returns the netstack table that base chains of type typ at
+// hooknum are compiled into. It returns false if such chains aren't
+// supported.
+func stackTable(typ string, hooknum uint32) (stack.TableID, bool) {
+	switch typ {
+	case "filter":
+		switch hooknum {
+		case linux.NF_INET_LOCAL_IN, linux.NF_INET_FORWARD, linux.NF_INET_LOCAL_OUT:
+			return stack.FilterID, true
+		case linux.NF_INET_PRE_ROUTING, linux.NF_INET_POST_ROUTING:
+			return stack.MangleID, true
+		}
+	case "nat":
+		switch hooknum {
+		case linux.NF_INET_PRE_ROUTING, linux.NF_INET_LOCAL_IN, linux.NF_INET_LOCAL_OUT, linux.NF_INET_POST_ROUTING:
+			return stack.NATID, true
+		}
+	case "route":
+		if hooknum == linux.NF_INET_LOCAL_OUT {
+			return stack.MangleID, true
+		}
+	}
+	return 0, false
+}
+
+// compileContext is the context of a chain being compiled.
+type compileContext struct {
+	table     *table
+	chainType string
+	hook      stack.Hook
+
+	// segments maps the names of the regular chains that may be jumped to
+	// to the index of their first rule.
+	segments map[string]int
+}
+
+// bind binds v to c.
+func (c *compileContext) bind(v verdict) boundVerdict {
+	b := boundVerdict{code: v.code}
+	if v.code == linux.NFT_JUMP {
+		b.jumpTo = c.segments[v.chain]
+	}
+	return b
+}
+
+// baseChain is a base chain and its table.
+type baseChain struct {
+	table *table
+	chain *chain
+}
+
+// compileTables compiles the base chains of tables that are compiled into
+// netstack's table id of the given IP version. It returns false if there are
+// none.
+func compileTables(tables []*table, id stack.TableID, ipv6 bool) (stack.Table, bool, *syserr.Error) {
+	var bases [stack.NumHooks][]baseChain
+	found := false
+	for _, t := range tables {
+		if t.flags&linux.NFT_TABLE_F_DORMANT != 0 {
+			continue
+		}
+		switch t.family {
+		case linux.NFPROTO_INET:
+		case linux.NFPROTO_IPV6:
+			if !ipv6 {
+				continue
+			}
+		default:
+			if ipv6 {
+				continue
+			}
+		}
+		for _, c := range t.chains {
+			if c.hook == nil {
+				continue
+			}
+			if tid, ok := stackTable(c.hook.typ, c.hook.hooknum); !ok || tid != id {
+				continue
+			}
+			bases[c.hook.hooknum] = append(bases[c.hook.hooknum], baseChain{t, c})
+			found = true
+		}
+	}
+	if !found {
+		return stack.Table{}, false, nil
+	}
+
+	netProto := header.IPv4ProtocolNumber
+	if ipv6 {
+		netProto = header.IPv6ProtocolNumber
+	}
+	var tbl stack.Table
+	for hook := stack.Hook(0); hook < stack.NumHooks; hook++ {
+		bs := bases[hook]
+		if len(bs) == 0 {
+			tbl.BuiltinChains[hook] = len(tbl.Rules)
+			tbl.Underflows[hook] = len(tbl.Rules)
+			tbl.Rules = append(tbl.Rules, stack.Rule{Target: &stack.AcceptTarget{NetworkProtocol: netProto}})
+			continue
+		}
+		sort.SliceStable(bs, func(i, j int) bool {
+			return bs[i].chain.hook.priority < bs[j].chain.hook.priority
+		})
+
+		// Lay out the chains, so that jumps can be compiled.
+		pos := len(tbl.Rules)
+		starts := make([]int, len(bs))
+		for i, b := range bs {
+			starts[i] = pos
+			pos += len(b.chain.rules) + 1
+		}
+		reachable := make([][]*chain, len(bs))
+		segments := make([]map[string]int, len(bs))
+		for i, b := range bs {
+			r, err := b.table.reachable(b.chain)
+			if err != nil {
+				return stack.Table{}, false, err
+			}
+			reachable[i] = r
+			segments[i] = make(map[string]int, len(r))
+			for _, c := range r {
+				segments[i][c.name] = pos
+				pos += len(c.rules) + 1
+			}
+		}
+
+		// Compile them.
+		type chainContext struct {
+			cc     compileContext
+			accept action
+		}
+		ctxs := make([]chainContext, len(bs))
+		for i, b := range bs {
+			ctxs[i] = chainContext{
+				cc: compileContext{
+					table:     b.table,
+					chainType: b.chain.hook.typ,
+					hook:      hook,
+					segments:  segments[i],
+				},
+				accept: action{verdict: stack.RuleAccept},
+			}
+			if i+1 < len(bs) {
+				ctxs[i].accept = action{verdict: stack.RuleJump, jumpTo: starts[i+1]}
+			}
+		}
+		for i, b := range bs {
+			policyIdx := starts[i] + len(b.chain.rules)
+			ret := action{verdict: stack.RuleJump, jumpTo: policyIdx}
+			if err := compileChain(&tbl, b.chain, &ctxs[i].cc, ctxs[i].accept, ret); err != nil {
+				return stack.Table{}, false, err
+			}
+			policy := ctxs[i].accept
+			if b.chain.policy == linux.NF_DROP {
+				policy = action{verdict: stack.RuleDrop}
+			}
+			tbl.Rules = append(tbl.Rules, stack.Rule{Target: &policyTarget{action: policy, counters: b.chain.counters}})
+		}
+		for i := range bs {
+			for _, c := range reachable[i] {
+				if err := compileChain(&tbl, c, &ctxs[i].cc, ctxs[i].accept, action{verdict: stack.RuleReturn}); err != nil {
+					return stack.Table{}, false, err
+				}
+				tbl.Rules = append(tbl.Rules, stack.Rule{Target: &stack.ReturnTarget{NetworkProtocol: netProto}})
+			}
+		}
+		tbl.BuiltinChains[hook] = starts[0]
+		// The policy of the last base chain is always accept or drop.
+		tbl.Underflows[hook] = starts[len(bs)-1] + len(bs[len(bs)-1].chain.rules)
+	}
+	return tbl, true, nil
+}
+
+// compileChain appends the rules of c to tbl.
+func compileChain(tbl *stack.Table, c *chain, cc *compileContext, accept, ret action) *syserr.Error {
+	for _, r := range c.rules {
+		rt := &ruleTarget{
+			exprs:  make([]expr, len(r.exprs)),
+			next:   len(tbl.Rules) + 1,
+			accept: accept,
+			ret:    ret,
+		}
+		for i, e := range r.exprs {
+			ce, err := e.compile(cc)
+			if err != nil {
+				return err
+			}
+			rt.exprs[i] = ce
+		}
+		tbl.Rules = append(tbl.Rules, stack.Rule{Target: rt})
+	}
+	return nil
+}
+
+// action is the result of a netstack target.
+type action struct {
+	verdict stack.RuleVerdict
+	jumpTo  int
+}
+
+// ruleTarget is a netstack target that evaluates an nftables rule. Since
+// their expressions may both match packets and act on them, nftables rules
+// are compiled into netstack rules without matchers.
+type ruleTarget struct {
+	exprs []expr
+
+	// next is the index of the next rule.
+	next int
+
+	// accept and ret are the results of NF_ACCEPT and NFT_RETURN verdicts.
+	accept action
+	ret    action
+}
+
+var _ stack.InterfaceTarget = (*ruleTarget)(nil)
+
+// Action implements stack.Target.Action.
+func (rt *ruleTarget) Action(pkt stack.PacketBufferPtr, hook stack.Hook, r *stack.Route, addressEP stack.AddressableEndpoint) (stack.RuleVerdict, int) {
+	return rt.InterfaceAction(pkt, hook, r, addressEP, "", "")
+}
+
+// InterfaceAction implements stack.InterfaceTarget.InterfaceAction.
+func (rt *ruleTarget) InterfaceAction(pkt stack.PacketBufferPtr, hook stack.Hook, r *stack.Route, addressEP stack.AddressableEndpoint, inNicName, outNicName string) (stack.RuleVerdict, int) {
+	pc := packetContext{
+		pkt:       pkt,
+		hook:      hook,
+		r:         r,
+		addressEP: addressEP,
+		inName:    inNicName,
+		outName:   outNicName,
+	}
+	regs := registers{verdict: boundVerdict{code: linux.NFT_CONTINUE}}
+	for _, e := range rt.exprs {
+		e.eval(&regs, &pc)
+		if regs.verdict.code != linux.NFT_CONTINUE {
+			break
+		}
+	}
+	switch regs.verdict.code {
+	case linux.NF_ACCEPT:
+		return rt.accept.verdict, rt.accept.jumpTo
+	case linux.NF_DROP:
+		return stack.RuleDrop, 0
+	case linux.NFT_JUMP:
+		return stack.RuleJump, regs.verdict.jumpTo
+	case linux.NFT_RETURN:
+		return rt.ret.verdict, rt.ret.jumpTo
+	default:
+		// NFT_CONTINUE and NFT_BREAK continue with the next rule.
+		return stack.RuleJump, rt.next
+	}
+}
+
+// policyTarget is a netstack target that applies the policy of a base chain.
+type policyTarget struct {
+	action   action
+	counters *chainCounters
+}
+
+// Action implements stack.Target.Action.
+func (pt *policyTarget) Action(pkt stack.PacketBufferPtr, _ stack.Hook, _ *stack.Route, _ stack.AddressableEndpoint) (stack.RuleVerdict, int) {
+	if pt.counters != nil {
+		pt.counters.packets.Add(1)
+		pt.counters.bytes.Add(uint64(packetLen(pkt)))
+	}
+	return pt.action.verdict, pt.action.jumpTo
+}
+
+// packetContext is the packet that a rule is evaluated on, and where it is
+// evaluated.
+type packetContext struct {
+	pkt       stack.PacketBufferPtr
+	hook      stack.Hook
+	r         *stack.Route
+	addressEP stack.AddressableEndpoint
+	inName    string
+	outName   string
+}
+
+// inputNIC returns the interface that the packet was received on, or 0 if
+// it is outgoing.
+func (pc *packetContext) inputNIC() tcpip.NICID {
+	switch pc.hook {
+	case stack.Prerouting, stack.Input, stack.Forward:
+		return pc.pkt.NICID
+	default:
+		return 0
+	}
+}
+
+// outputNIC returns the interface that the packet is sent on, or 0 if it is
+// incoming.
+func (pc *packetContext) outputNIC() tcpip.NICID {
+	switch pc.hook {
+	case stack.Forward, stack.Output, stack.Postrouting:
+		if pc.r != nil {
+			return pc.r.NICID()
+		}
+	}
+	return 0
+}
+
+// packetLen returns the length of pkt from its network header.
+func packetLen(pkt stack.PacketBufferPtr) int {
+	return len(pkt.NetworkHeader().Slice()) + len(pkt.TransportHeader().Slice()) + pkt.Data().Size()
+}
+
+// destinationPort returns the destination port of TCP and UDP packets, or 0.
+func destinationPort(pkt stack.PacketBufferPtr) uint16 {
+	th := pkt.TransportHeader().Slice()
+	switch pkt.TransportProtocolNumber {
+	case header.TCPProtocolNumber:
+		if len(th) >= header.TCPMinimumSize {
+			return header.TCP(th).DestinationPort()
+		}
+	case header.UDPProtocolNumber:
+		if len(th) >= header.UDPMinimumSize {
+			return header.UDP(th).DestinationPort()
+		}
+	}
+	return 0
+}
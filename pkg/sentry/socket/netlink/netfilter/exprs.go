@@ -0,0 +1,1039 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/bits"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// expr is an nftables expression.
+type expr interface {
+	// name returns the name of the expression type, e.g. "cmp".
+	name() string
+
+	// dump adds the NFTA_EXPR_DATA attributes of the expression to b.
+	dump(b *attrBuilder)
+
+	// compile returns the expression as evaluated in the context of c. It
+	// returns the expression itself if it doesn't depend on c.
+	compile(c *compileContext) (expr, *syserr.Error)
+
+	// eval evaluates the compiled expression on a packet.
+	eval(regs *registers, pc *packetContext)
+}
+
+// exprContext is the context that the expressions of a new rule are parsed
+// in.
+type exprContext struct {
+	tx    *transaction
+	table *table
+}
+
+// exprParsers maps the names of supported expression types to their parsers.
+var exprParsers = map[string]func(ec *exprContext, a attrs) (expr, *syserr.Error){
+	"bitwise":   parseBitwise,
+	"cmp":       parseCmp,
+	"counter":   parseCounter,
+	"immediate": parseImmediate,
+	"lookup":    parseLookup,
+	"masq":      parseMasq,
+	"meta":      parseMeta,
+	"nat":       parseNAT,
+	"payload":   parsePayload,
+}
+
+// parseExprs parses the value of an NFTA_RULE_EXPRESSIONS attribute.
+func parseExprs(ec *exprContext, b []byte) ([]expr, *syserr.Error) {
+	list, err := parseAttrList(b)
+	if err != nil {
+		return nil, err
+	}
+	exprs := make([]expr, 0, len(list))
+	for _, el := range list {
+		if el.typ != linux.NFTA_LIST_ELEM {
+			return nil, syserr.ErrInvalidArgument
+		}
+		a, err := parseAttrs(el.value)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := a.string(linux.NFTA_EXPR_NAME)
+		if !ok {
+			return nil, syserr.ErrInvalidArgument
+		}
+		parse, ok := exprParsers[name]
+		if !ok {
+			return nil, syserr.ErrNotSupported
+		}
+		data, _, err := a.nested(linux.NFTA_EXPR_DATA)
+		if err != nil {
+			return nil, err
+		}
+		e, err := parse(ec, data)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs, nil
+}
+
+// dumpExprs returns the value of the NFTA_RULE_EXPRESSIONS attribute for
+// exprs.
+func dumpExprs(exprs []expr) attrBuilder {
+	var list attrBuilder
+	for _, e := range exprs {
+		var el, data attrBuilder
+		el.putString(linux.NFTA_EXPR_NAME, e.name())
+		e.dump(&data)
+		el.putNested(linux.NFTA_EXPR_DATA, data)
+		list.putNested(linux.NFTA_LIST_ELEM, el)
+	}
+	return list
+}
+
+// dataRegistersSize is the size of the data registers. NFT_REG_1 to
+// NFT_REG_4 are 16 bytes each, and NFT_REG32_00 to NFT_REG32_15 are 4-byte
+// views of the same memory.
+const dataRegistersSize = 4 * linux.NFT_REG_SIZE
+
+// registers are the registers that rules are evaluated with.
+type registers struct {
+	verdict boundVerdict
+	data    [dataRegistersSize]byte
+}
+
+// store copies v to the data registers at off, and zeroes the rest of the
+// last 32-bit register written, as Linux does.
+func (regs *registers) store(off int, v []byte) {
+	n := copy(regs.data[off:], v)
+	regs.pad(off, n)
+}
+
+// pad zeroes the rest of the last 32-bit register of n bytes written at off.
+func (regs *registers) pad(off, n int) {
+	for i := off + n; i < off+bits.AlignUp(n, linux.NFT_REG32_SIZE); i++ {
+		regs.data[i] = 0
+	}
+}
+
+// regOffset returns the offset in registers.data of the data register reg,
+// which is used to load or store n bytes.
+func regOffset(reg uint32, n int) (int, *syserr.Error) {
+	var off int
+	switch {
+	case reg >= linux.NFT_REG_1 && reg <= linux.NFT_REG_4:
+		off = int(reg-linux.NFT_REG_1) * linux.NFT_REG_SIZE
+	case reg >= linux.NFT_REG32_00 && reg <= linux.NFT_REG32_15:
+		off = int(reg-linux.NFT_REG32_00) * linux.NFT_REG32_SIZE
+	default:
+		return 0, syserr.ErrRange
+	}
+	if n <= 0 || off+n > dataRegistersSize {
+		return 0, syserr.ErrRange
+	}
+	return off, nil
+}
+
+// register parses the data register attribute typ, which is used to load or
+// store n bytes, and returns its offset in registers.data.
+func (a attrs) register(typ uint16, n int) (int, *syserr.Error) {
+	reg, ok := a.uint32(typ)
+	if !ok {
+		return 0, syserr.ErrInvalidArgument
+	}
+	return regOffset(reg, n)
+}
+
+// regNumber returns the register to report for the data register at off. As
+// in Linux, 16-byte aligned registers are reported as NFT_REG_1 to NFT_REG_4.
+func regNumber(off int) uint32 {
+	if off%linux.NFT_REG_SIZE == 0 {
+		return linux.NFT_REG_1 + uint32(off/linux.NFT_REG_SIZE)
+	}
+	return linux.NFT_REG32_00 + uint32(off/linux.NFT_REG32_SIZE)
+}
+
+// verdict is an nftables verdict.
+//
+// +stateify savable
+type verdict struct {
+	// code is NF_ACCEPT, NF_DROP or one of NFT_CONTINUE, NFT_BREAK, NFT_JUMP
+	// and NFT_RETURN.
+	code int32
+
+	// chain is the name of the chain that NFT_JUMP verdicts jump to.
+	chain string
+}
+
+// boundVerdict is a verdict bound to the context it's compiled in.
+type boundVerdict struct {
+	code int32
+
+	// jumpTo is the index of the first rule of the chain that NFT_JUMP
+	// verdicts jump to.
+	jumpTo int
+}
+
+// data is the value of an NFTA_*_DATA attribute: either a value or a
+// verdict.
+//
+// +stateify savable
+type data struct {
+	value     []byte
+	isVerdict bool
+	verdict   verdict
+}
+
+// parseValue parses the value of a NFTA_*_DATA attribute that must hold a
+// value.
+func parseValue(b []byte) ([]byte, *syserr.Error) {
+	a, err := parseAttrs(b)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := a[linux.NFTA_DATA_VALUE]
+	if !ok || len(v) == 0 || len(v) > linux.NFT_DATA_VALUE_MAXLEN {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// parseData parses the value of a NFTA_*_DATA attribute. Jump verdicts must
+// name a regular chain of ec.table.
+func parseData(ec *exprContext, b []byte) (data, *syserr.Error) {
+	a, err := parseAttrs(b)
+	if err != nil {
+		return data{}, err
+	}
+	if !a.has(linux.NFTA_DATA_VERDICT) {
+		v, err := parseValue(b)
+		return data{value: v}, err
+	}
+	va, _, err := a.nested(linux.NFTA_DATA_VERDICT)
+	if err != nil {
+		return data{}, err
+	}
+	code, ok := va.uint32(linux.NFTA_VERDICT_CODE)
+	if !ok {
+		return data{}, syserr.ErrInvalidArgument
+	}
+	d := data{isVerdict: true, verdict: verdict{code: int32(code)}}
+	switch d.verdict.code {
+	case linux.NF_ACCEPT, linux.NF_DROP, linux.NFT_CONTINUE, linux.NFT_BREAK, linux.NFT_RETURN:
+	case linux.NFT_JUMP:
+		var c *chain
+		if name, ok := va.string(linux.NFTA_VERDICT_CHAIN); ok {
+			c = ec.table.chain(name)
+		} else if id, ok := va.uint32(linux.NFTA_VERDICT_CHAIN_ID); ok {
+			c = ec.tx.chainIDs[id]
+			if c != nil && ec.table.chain(c.name) != c {
+				c = nil
+			}
+		} else {
+			return data{}, syserr.ErrInvalidArgument
+		}
+		if c == nil {
+			return data{}, syserr.ErrNoFileOrDir
+		}
+		if c.hook != nil {
+			// Base chains can't be jumped to.
+			return data{}, syserr.ErrNotSupported
+		}
+		d.verdict.chain = c.name
+	case linux.NFT_GOTO, linux.NF_QUEUE:
+		return data{}, syserr.ErrNotSupported
+	default:
+		return data{}, syserr.ErrInvalidArgument
+	}
+	return d, nil
+}
+
+// jumpsTo returns whether d is a jump to the chain named name.
+func (d *data) jumpsTo(name string) bool {
+	return d.isVerdict && d.verdict.code == linux.NFT_JUMP && d.verdict.chain == name
+}
+
+// len returns the length of d in registers.
+func (d *data) len() int {
+	return len(d.value)
+}
+
+// dump adds d to b as the nested attribute typ.
+func (d *data) dump(b *attrBuilder, typ uint16) {
+	var n attrBuilder
+	if d.isVerdict {
+		var v attrBuilder
+		v.putUint32(linux.NFTA_VERDICT_CODE, uint32(d.verdict.code))
+		if d.verdict.code == linux.NFT_JUMP {
+			v.putString(linux.NFTA_VERDICT_CHAIN, d.verdict.chain)
+		}
+		n.putNested(linux.NFTA_DATA_VERDICT, v)
+	} else {
+		n.put(linux.NFTA_DATA_VALUE, d.value)
+	}
+	b.putNested(typ, n)
+}
+
+// immediateExpr loads data into a register.
+//
+// +stateify savable
+type immediateExpr struct {
+	// dreg is the offset of the destination data register, if the data
+	// isn't a verdict.
+	dreg int
+	data data
+
+	// bound is the verdict, if the data is one, as compiled.
+	bound boundVerdict `state:"nosave"`
+}
+
+func parseImmediate(ec *exprContext, a attrs) (expr, *syserr.Error) {
+	reg, ok := a.uint32(linux.NFTA_IMMEDIATE_DREG)
+	if !ok || !a.has(linux.NFTA_IMMEDIATE_DATA) {
+		return nil, syserr.ErrInvalidArgument
+	}
+	d, err := parseData(ec, a[linux.NFTA_IMMEDIATE_DATA])
+	if err != nil {
+		return nil, err
+	}
+	e := &immediateExpr{data: d}
+	if reg == linux.NFT_REG_VERDICT {
+		if !d.isVerdict {
+			return nil, syserr.ErrInvalidArgument
+		}
+		return e, nil
+	}
+	if d.isVerdict {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if e.dreg, err = regOffset(reg, d.len()); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (*immediateExpr) name() string {
+	return "immediate"
+}
+
+func (e *immediateExpr) dump(b *attrBuilder) {
+	reg := uint32(linux.NFT_REG_VERDICT)
+	if !e.data.isVerdict {
+		reg = regNumber(e.dreg)
+	}
+	b.putUint32(linux.NFTA_IMMEDIATE_DREG, reg)
+	e.data.dump(b, linux.NFTA_IMMEDIATE_DATA)
+}
+
+func (e *immediateExpr) compile(c *compileContext) (expr, *syserr.Error) {
+	if !e.data.isVerdict {
+		return e, nil
+	}
+	ce := *e
+	ce.bound = c.bind(e.data.verdict)
+	return &ce, nil
+}
+
+func (e *immediateExpr) eval(regs *registers, pc *packetContext) {
+	if e.data.isVerdict {
+		regs.verdict = e.bound
+		return
+	}
+	regs.store(e.dreg, e.data.value)
+}
+
+// cmpExpr compares a register with data.
+//
+// +stateify savable
+type cmpExpr struct {
+	// sreg is the offset of the source data register.
+	sreg int
+
+	// op is a NFT_CMP_* operation.
+	op   uint32
+	data []byte
+}
+
+func parseCmp(ec *exprContext, a attrs) (expr, *syserr.Error) {
+	op, ok := a.uint32(linux.NFTA_CMP_OP)
+	if !ok || !a.has(linux.NFTA_CMP_DATA) {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if op > linux.NFT_CMP_GTE {
+		return nil, syserr.ErrInvalidArgument
+	}
+	v, err := parseValue(a[linux.NFTA_CMP_DATA])
+	if err != nil {
+		return nil, err
+	}
+	sreg, err := a.register(linux.NFTA_CMP_SREG, len(v))
+	if err != nil {
+		return nil, err
+	}
+	return &cmpExpr{sreg: sreg, op: op, data: v}, nil
+}
+
+func (*cmpExpr) name() string {
+	return "cmp"
+}
+
+func (e *cmpExpr) dump(b *attrBuilder) {
+	b.putUint32(linux.NFTA_CMP_SREG, regNumber(e.sreg))
+	b.putUint32(linux.NFTA_CMP_OP, e.op)
+	(&data{value: e.data}).dump(b, linux.NFTA_CMP_DATA)
+}
+
+func (e *cmpExpr) compile(*compileContext) (expr, *syserr.Error) {
+	return e, nil
+}
+
+func (e *cmpExpr) eval(regs *registers, pc *packetContext) {
+	d := bytes.Compare(regs.data[e.sreg:e.sreg+len(e.data)], e.data)
+	var match bool
+	switch e.op {
+	case linux.NFT_CMP_EQ:
+		match = d == 0
+	case linux.NFT_CMP_NEQ:
+		match = d != 0
+	case linux.NFT_CMP_LT:
+		match = d < 0
+	case linux.NFT_CMP_LTE:
+		match = d <= 0
+	case linux.NFT_CMP_GT:
+		match = d > 0
+	case linux.NFT_CMP_GTE:
+		match = d >= 0
+	}
+	if !match {
+		regs.verdict.code = linux.NFT_BREAK
+	}
+}
+
+// payloadExpr loads packet data into a register.
+//
+// +stateify savable
+type payloadExpr struct {
+	// dreg is the offset of the destination data register.
+	dreg int
+
+	// base is NFT_PAYLOAD_NETWORK_HEADER or NFT_PAYLOAD_TRANSPORT_HEADER.
+	base   uint32
+	offset uint32
+	len    uint32
+}
+
+func parsePayload(ec *exprContext, a attrs) (expr, *syserr.Error) {
+	if a.has(linux.NFTA_PAYLOAD_SREG) {
+		// Packet mangling isn't supported.
+		return nil, syserr.ErrNotSupported
+	}
+	base, ok := a.uint32(linux.NFTA_PAYLOAD_BASE)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	switch base {
+	case linux.NFT_PAYLOAD_NETWORK_HEADER, linux.NFT_PAYLOAD_TRANSPORT_HEADER:
+	default:
+		return nil, syserr.ErrNotSupported
+	}
+	offset, ok := a.uint32(linux.NFTA_PAYLOAD_OFFSET)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	l, ok := a.uint32(linux.NFTA_PAYLOAD_LEN)
+	if !ok || l == 0 || l > linux.NFT_DATA_VALUE_MAXLEN || offset > 0xff {
+		return nil, syserr.ErrInvalidArgument
+	}
+	dreg, err := a.register(linux.NFTA_PAYLOAD_DREG, int(l))
+	if err != nil {
+		return nil, err
+	}
+	return &payloadExpr{dreg: dreg, base: base, offset: offset, len: l}, nil
+}
+
+func (*payloadExpr) name() string {
+	return "payload"
+}
+
+func (e *payloadExpr) dump(b *attrBuilder) {
+	b.putUint32(linux.NFTA_PAYLOAD_DREG, regNumber(e.dreg))
+	b.putUint32(linux.NFTA_PAYLOAD_BASE, e.base)
+	b.putUint32(linux.NFTA_PAYLOAD_OFFSET, e.offset)
+	b.putUint32(linux.NFTA_PAYLOAD_LEN, e.len)
+}
+
+func (e *payloadExpr) compile(*compileContext) (expr, *syserr.Error) {
+	return e, nil
+}
+
+func (e *payloadExpr) eval(regs *registers, pc *packetContext) {
+	dst := regs.data[e.dreg : e.dreg+int(e.len)]
+	var ok bool
+	switch e.base {
+	case linux.NFT_PAYLOAD_NETWORK_HEADER:
+		ok = readHeaders(dst, int(e.offset), pc.pkt.NetworkHeader().Slice(), pc.pkt.TransportHeader().Slice())
+	case linux.NFT_PAYLOAD_TRANSPORT_HEADER:
+		ok = readHeaders(dst, int(e.offset), pc.pkt.TransportHeader().Slice())
+	}
+	if !ok {
+		regs.verdict.code = linux.NFT_BREAK
+		return
+	}
+	regs.pad(e.dreg, int(e.len))
+}
+
+// readHeaders fills dst with the bytes at off in the concatenation of hdrs.
+// It returns false if there aren't enough bytes.
+func readHeaders(dst []byte, off int, hdrs ...[]byte) bool {
+	for _, h := range hdrs {
+		if off >= len(h) {
+			off -= len(h)
+			continue
+		}
+		n := copy(dst, h[off:])
+		dst = dst[n:]
+		off = 0
+		if len(dst) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// metaExpr loads packet metadata into a register.
+//
+// +stateify savable
+type metaExpr struct {
+	// dreg is the offset of the destination data register.
+	dreg int
+
+	// key is a NFT_META_* key.
+	key uint32
+}
+
+// metaLen returns the length of the metadata key, or 0 if key isn't
+// supported.
+func metaLen(key uint32) int {
+	switch key {
+	case linux.NFT_META_LEN, linux.NFT_META_IIF, linux.NFT_META_OIF:
+		return 4
+	case linux.NFT_META_PROTOCOL:
+		return 2
+	case linux.NFT_META_NFPROTO, linux.NFT_META_L4PROTO:
+		return 1
+	case linux.NFT_META_IIFNAME, linux.NFT_META_OIFNAME:
+		return linux.IFNAMSIZ
+	default:
+		return 0
+	}
+}
+
+func parseMeta(ec *exprContext, a attrs) (expr, *syserr.Error) {
+	if a.has(linux.NFTA_META_SREG) {
+		// Setting metadata isn't supported.
+		return nil, syserr.ErrNotSupported
+	}
+	key, ok := a.uint32(linux.NFTA_META_KEY)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	l := metaLen(key)
+	if l == 0 {
+		return nil, syserr.ErrNotSupported
+	}
+	dreg, err := a.register(linux.NFTA_META_DREG, l)
+	if err != nil {
+		return nil, err
+	}
+	return &metaExpr{dreg: dreg, key: key}, nil
+}
+
+func (*metaExpr) name() string {
+	return "meta"
+}
+
+func (e *metaExpr) dump(b *attrBuilder) {
+	b.putUint32(linux.NFTA_META_KEY, e.key)
+	b.putUint32(linux.NFTA_META_DREG, regNumber(e.dreg))
+}
+
+func (e *metaExpr) compile(*compileContext) (expr, *syserr.Error) {
+	return e, nil
+}
+
+func (e *metaExpr) eval(regs *registers, pc *packetContext) {
+	var buf [linux.IFNAMSIZ]byte
+	pkt := pc.pkt
+	switch e.key {
+	case linux.NFT_META_LEN:
+		hostarch.ByteOrder.PutUint32(buf[:], uint32(packetLen(pkt)))
+	case linux.NFT_META_PROTOCOL:
+		// The protocol is the EtherType, in network byte order.
+		binary.BigEndian.PutUint16(buf[:], uint16(pkt.NetworkProtocolNumber))
+	case linux.NFT_META_NFPROTO:
+		buf[0] = linux.NFPROTO_IPV4
+		if pkt.NetworkProtocolNumber == header.IPv6ProtocolNumber {
+			buf[0] = linux.NFPROTO_IPV6
+		}
+	case linux.NFT_META_L4PROTO:
+		buf[0] = uint8(pkt.TransportProtocolNumber)
+	case linux.NFT_META_IIF:
+		nic := pc.inputNIC()
+		if nic == 0 {
+			regs.verdict.code = linux.NFT_BREAK
+			return
+		}
+		hostarch.ByteOrder.PutUint32(buf[:], uint32(nic))
+	case linux.NFT_META_OIF:
+		nic := pc.outputNIC()
+		if nic == 0 {
+			regs.verdict.code = linux.NFT_BREAK
+			return
+		}
+		hostarch.ByteOrder.PutUint32(buf[:], uint32(nic))
+	case linux.NFT_META_IIFNAME:
+		if pc.inName == "" {
+			regs.verdict.code = linux.NFT_BREAK
+			return
+		}
+		copy(buf[:], pc.inName)
+	case linux.NFT_META_OIFNAME:
+		if pc.outName == "" {
+			regs.verdict.code = linux.NFT_BREAK
+			return
+		}
+		copy(buf[:], pc.outName)
+	}
+	regs.store(e.dreg, buf[:metaLen(e.key)])
+}
+
+// bitwiseExpr applies a mask and xor to a register.
+//
+// +stateify savable
+type bitwiseExpr struct {
+	// sreg and dreg are the offsets of the source and destination data
+	// registers.
+	sreg int
+	dreg int
+	mask []byte
+	xor  []byte
+}
+
+func parseBitwise(ec *exprContext, a attrs) (expr, *syserr.Error) {
+	if op, ok := a.uint32(linux.NFTA_BITWISE_OP); ok && op != linux.NFT_BITWISE_BOOL {
+		// Shifts aren't supported.
+		return nil, syserr.ErrNotSupported
+	}
+	l, ok := a.uint32(linux.NFTA_BITWISE_LEN)
+	if !ok || l == 0 || l > linux.NFT_DATA_VALUE_MAXLEN || !a.has(linux.NFTA_BITWISE_MASK) || !a.has(linux.NFTA_BITWISE_XOR) {
+		return nil, syserr.ErrInvalidArgument
+	}
+	mask, err := parseValue(a[linux.NFTA_BITWISE_MASK])
+	if err != nil {
+		return nil, err
+	}
+	xor, err := parseValue(a[linux.NFTA_BITWISE_XOR])
+	if err != nil {
+		return nil, err
+	}
+	if len(mask) != int(l) || len(xor) != int(l) {
+		return nil, syserr.ErrInvalidArgument
+	}
+	e := &bitwiseExpr{mask: mask, xor: xor}
+	if e.sreg, err = a.register(linux.NFTA_BITWISE_SREG, int(l)); err != nil {
+		return nil, err
+	}
+	if e.dreg, err = a.register(linux.NFTA_BITWISE_DREG, int(l)); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (*bitwiseExpr) name() string {
+	return "bitwise"
+}
+
+func (e *bitwiseExpr) dump(b *attrBuilder) {
+	b.putUint32(linux.NFTA_BITWISE_SREG, regNumber(e.sreg))
+	b.putUint32(linux.NFTA_BITWISE_DREG, regNumber(e.dreg))
+	b.putUint32(linux.NFTA_BITWISE_LEN, uint32(len(e.mask)))
+	b.putUint32(linux.NFTA_BITWISE_OP, linux.NFT_BITWISE_BOOL)
+	(&data{value: e.mask}).dump(b, linux.NFTA_BITWISE_MASK)
+	(&data{value: e.xor}).dump(b, linux.NFTA_BITWISE_XOR)
+}
+
+func (e *bitwiseExpr) compile(*compileContext) (expr, *syserr.Error) {
+	return e, nil
+}
+
+func (e *bitwiseExpr) eval(regs *registers, pc *packetContext) {
+	for i := range e.mask {
+		regs.data[e.dreg+i] = regs.data[e.sreg+i]&e.mask[i] ^ e.xor[i]
+	}
+}
+
+// counterExpr counts the packets and bytes that reach it. Its counters are
+// shared by all copies of the rule.
+//
+// +stateify savable
+type counterExpr struct {
+	packets atomicbitops.Uint64
+	bytes   atomicbitops.Uint64
+}
+
+func parseCounter(ec *exprContext, a attrs) (expr, *syserr.Error) {
+	e := &counterExpr{}
+	if v, ok := a.uint64(linux.NFTA_COUNTER_PACKETS); ok {
+		e.packets.Store(v)
+	}
+	if v, ok := a.uint64(linux.NFTA_COUNTER_BYTES); ok {
+		e.bytes.Store(v)
+	}
+	return e, nil
+}
+
+func (*counterExpr) name() string {
+	return "counter"
+}
+
+func (e *counterExpr) dump(b *attrBuilder) {
+	b.putUint64(linux.NFTA_COUNTER_BYTES, e.bytes.Load())
+	b.putUint64(linux.NFTA_COUNTER_PACKETS, e.packets.Load())
+}
+
+func (e *counterExpr) compile(*compileContext) (expr, *syserr.Error) {
+	return e, nil
+}
+
+func (e *counterExpr) eval(regs *registers, pc *packetContext) {
+	e.packets.Add(1)
+	e.bytes.Add(uint64(packetLen(pc.pkt)))
+}
+
+// natExpr translates the source or destination address and port of
+// connections to the values of registers.
+//
+// +stateify savable
+type natExpr struct {
+	// typ is NFT_NAT_SNAT or NFT_NAT_DNAT.
+	typ uint32
+
+	// family is the NFPROTO_* family of the address.
+	family uint32
+
+	// addr is the offset of the data register holding the address.
+	addr int
+
+	// proto is the offset of the data register holding the port, or -1 if
+	// the port isn't translated.
+	proto int
+
+	flags uint32
+}
+
+func parseNAT(ec *exprContext, a attrs) (expr, *syserr.Error) {
+	typ, ok := a.uint32(linux.NFTA_NAT_TYPE)
+	if !ok || (typ != linux.NFT_NAT_SNAT && typ != linux.NFT_NAT_DNAT) {
+		return nil, syserr.ErrInvalidArgument
+	}
+	family, ok := a.uint32(linux.NFTA_NAT_FAMILY)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var alen int
+	switch family {
+	case linux.NFPROTO_IPV4:
+		alen = header.IPv4AddressSize
+	case linux.NFPROTO_IPV6:
+		alen = header.IPv6AddressSize
+	default:
+		return nil, syserr.ErrAddressFamilyNotSupported
+	}
+	if tf := ec.table.family; tf != linux.NFPROTO_INET && uint32(tf) != family {
+		return nil, syserr.ErrNotSupported
+	}
+	// Randomization and persistence flags are accepted, but have no effect.
+	flags, _ := a.uint32(linux.NFTA_NAT_FLAGS)
+	if flags&^linux.NF_NAT_RANGE_MASK != 0 {
+		return nil, syserr.ErrNotSupported
+	}
+	// Only single addresses and ports are supported, not ranges.
+	if !a.has(linux.NFTA_NAT_REG_ADDR_MIN) || differentRegisters(a, linux.NFTA_NAT_REG_ADDR_MIN, linux.NFTA_NAT_REG_ADDR_MAX) || differentRegisters(a, linux.NFTA_NAT_REG_PROTO_MIN, linux.NFTA_NAT_REG_PROTO_MAX) {
+		return nil, syserr.ErrNotSupported
+	}
+	e := &natExpr{typ: typ, family: family, proto: -1, flags: flags}
+	var err *syserr.Error
+	if e.addr, err = a.register(linux.NFTA_NAT_REG_ADDR_MIN, alen); err != nil {
+		return nil, err
+	}
+	if a.has(linux.NFTA_NAT_REG_PROTO_MIN) {
+		if e.proto, err = a.register(linux.NFTA_NAT_REG_PROTO_MIN, 2); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// differentRegisters returns whether the attributes min and max are both
+// present and name different registers.
+func differentRegisters(a attrs, min, max uint16) bool {
+	maxReg, ok := a.uint32(max)
+	if !ok {
+		return false
+	}
+	minReg, _ := a.uint32(min)
+	return minReg != maxReg
+}
+
+func (*natExpr) name() string {
+	return "nat"
+}
+
+func (e *natExpr) dump(b *attrBuilder) {
+	b.putUint32(linux.NFTA_NAT_TYPE, e.typ)
+	b.putUint32(linux.NFTA_NAT_FAMILY, e.family)
+	b.putUint32(linux.NFTA_NAT_REG_ADDR_MIN, regNumber(e.addr))
+	b.putUint32(linux.NFTA_NAT_REG_ADDR_MAX, regNumber(e.addr))
+	if e.proto >= 0 {
+		b.putUint32(linux.NFTA_NAT_REG_PROTO_MIN, regNumber(e.proto))
+		b.putUint32(linux.NFTA_NAT_REG_PROTO_MAX, regNumber(e.proto))
+	}
+	if e.flags != 0 {
+		b.putUint32(linux.NFTA_NAT_FLAGS, e.flags)
+	}
+}
+
+func (e *natExpr) compile(c *compileContext) (expr, *syserr.Error) {
+	if c.chainType != "nat" {
+		return nil, syserr.ErrNotSupported
+	}
+	switch {
+	case e.typ == linux.NFT_NAT_DNAT && (c.hook == stack.Prerouting || c.hook == stack.Output):
+	case e.typ == linux.NFT_NAT_SNAT && (c.hook == stack.Postrouting || c.hook == stack.Input):
+	default:
+		return nil, syserr.ErrNotSupported
+	}
+	return e, nil
+}
+
+func (e *natExpr) eval(regs *registers, pc *packetContext) {
+	pkt := pc.pkt
+	var alen int
+	switch {
+	case e.family == linux.NFPROTO_IPV4 && pkt.NetworkProtocolNumber == header.IPv4ProtocolNumber:
+		alen = header.IPv4AddressSize
+	case e.family == linux.NFPROTO_IPV6 && pkt.NetworkProtocolNumber == header.IPv6ProtocolNumber:
+		alen = header.IPv6AddressSize
+	default:
+		// As in Linux, nat expressions of inet tables only apply to
+		// packets of their family.
+		return
+	}
+	addr := tcpip.Address(regs.data[e.addr : e.addr+alen])
+	var port uint16
+	if e.proto >= 0 {
+		port = binary.BigEndian.Uint16(regs.data[e.proto:])
+	}
+	var v stack.RuleVerdict
+	if e.typ == linux.NFT_NAT_DNAT {
+		if port == 0 {
+			port = destinationPort(pkt)
+		}
+		t := stack.DNATTarget{Addr: addr, Port: port, NetworkProtocol: pkt.NetworkProtocolNumber}
+		v, _ = t.Action(pkt, pc.hook, pc.r, pc.addressEP)
+	} else {
+		t := stack.SNATTarget{Addr: addr, Port: port, NetworkProtocol: pkt.NetworkProtocolNumber}
+		v, _ = t.Action(pkt, pc.hook, pc.r, pc.addressEP)
+	}
+	regs.verdict.code = ruleVerdictCode(v)
+}
+
+// masqExpr translates the source address of connections to the address of
+// the outgoing interface.
+//
+// +stateify savable
+type masqExpr struct {
+	flags uint32
+}
+
+func parseMasq(ec *exprContext, a attrs) (expr, *syserr.Error) {
+	if a.has(linux.NFTA_MASQ_REG_PROTO_MIN) || a.has(linux.NFTA_MASQ_REG_PROTO_MAX) {
+		// Port ranges aren't supported.
+		return nil, syserr.ErrNotSupported
+	}
+	flags, _ := a.uint32(linux.NFTA_MASQ_FLAGS)
+	if flags&^linux.NF_NAT_RANGE_MASK != 0 {
+		return nil, syserr.ErrNotSupported
+	}
+	return &masqExpr{flags: flags}, nil
+}
+
+func (*masqExpr) name() string {
+	return "masq"
+}
+
+func (e *masqExpr) dump(b *attrBuilder) {
+	if e.flags != 0 {
+		b.putUint32(linux.NFTA_MASQ_FLAGS, e.flags)
+	}
+}
+
+func (e *masqExpr) compile(c *compileContext) (expr, *syserr.Error) {
+	if c.chainType != "nat" || c.hook != stack.Postrouting {
+		return nil, syserr.ErrNotSupported
+	}
+	return e, nil
+}
+
+func (e *masqExpr) eval(regs *registers, pc *packetContext) {
+	t := stack.MasqueradeTarget{NetworkProtocol: pc.pkt.NetworkProtocolNumber}
+	v, _ := t.Action(pc.pkt, pc.hook, pc.r, pc.addressEP)
+	regs.verdict.code = ruleVerdictCode(v)
+}
+
+// ruleVerdictCode returns the verdict code of the result of a NAT target.
+func ruleVerdictCode(v stack.RuleVerdict) int32 {
+	if v == stack.RuleAccept {
+		return linux.NF_ACCEPT
+	}
+	return linux.NF_DROP
+}
+
+// lookupExpr looks up a register in a set, and for maps loads the data the
+// register maps to into another register.
+//
+// +stateify savable
+type lookupExpr struct {
+	// set is the name of the set.
+	set string
+
+	// sreg is the offset of the source data register, of keyLen bytes.
+	sreg   int
+	keyLen int
+
+	// isMap is true if the expression loads the data of the element, into
+	// the verdict register if verdict is true and otherwise into the data
+	// register at offset dreg.
+	isMap   bool
+	verdict bool
+	dreg    int
+
+	// flags are NFT_LOOKUP_F_* flags.
+	flags uint32
+
+	// compiled is the set as compiled.
+	compiled *compiledSet `state:"nosave"`
+}
+
+func parseLookup(ec *exprContext, a attrs) (expr, *syserr.Error) {
+	var s *set
+	if name, ok := a.string(linux.NFTA_LOOKUP_SET); ok {
+		s = ec.table.set(name)
+	} else if id, ok := a.uint32(linux.NFTA_LOOKUP_SET_ID); ok {
+		s = ec.tx.setIDs[id]
+		if s != nil && ec.table.set(s.name) != s {
+			s = nil
+		}
+	} else {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if s == nil {
+		return nil, syserr.ErrNoFileOrDir
+	}
+	flags, _ := a.uint32(linux.NFTA_LOOKUP_FLAGS)
+	if flags&^linux.NFT_LOOKUP_F_INV != 0 {
+		return nil, syserr.ErrNotSupported
+	}
+	e := &lookupExpr{set: s.name, keyLen: s.keyLen, flags: flags}
+	var err *syserr.Error
+	if e.sreg, err = a.register(linux.NFTA_LOOKUP_SREG, s.keyLen); err != nil {
+		return nil, err
+	}
+	if !a.has(linux.NFTA_LOOKUP_DREG) {
+		return e, nil
+	}
+	if !s.isMap() || flags&linux.NFT_LOOKUP_F_INV != 0 {
+		return nil, syserr.ErrInvalidArgument
+	}
+	e.isMap = true
+	reg, _ := a.uint32(linux.NFTA_LOOKUP_DREG)
+	if (reg == linux.NFT_REG_VERDICT) != (s.dataType == linux.NFT_DATA_VERDICT) {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if reg == linux.NFT_REG_VERDICT {
+		e.verdict = true
+		return e, nil
+	}
+	if e.dreg, err = regOffset(reg, s.dataLen); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (*lookupExpr) name() string {
+	return "lookup"
+}
+
+func (e *lookupExpr) dump(b *attrBuilder) {
+	b.putString(linux.NFTA_LOOKUP_SET, e.set)
+	b.putUint32(linux.NFTA_LOOKUP_SREG, regNumber(e.sreg))
+	if e.isMap {
+		reg := uint32(linux.NFT_REG_VERDICT)
+		if !e.verdict {
+			reg = regNumber(e.dreg)
+		}
+		b.putUint32(linux.NFTA_LOOKUP_DREG, reg)
+	}
+	b.putUint32(linux.NFTA_LOOKUP_FLAGS, e.flags)
+}
+
+func (e *lookupExpr) compile(c *compileContext) (expr, *syserr.Error) {
+	s := c.table.set(e.set)
+	if s == nil {
+		return nil, syserr.ErrNoFileOrDir
+	}
+	ce := *e
+	ce.compiled = compileSet(c, s)
+	return &ce, nil
+}
+
+func (e *lookupExpr) eval(regs *registers, pc *packetContext) {
+	v, found := e.compiled.lookup(regs.data[e.sreg : e.sreg+e.keyLen])
+	if e.flags&linux.NFT_LOOKUP_F_INV != 0 {
+		found = !found
+	}
+	if !found {
+		regs.verdict.code = linux.NFT_BREAK
+		return
+	}
+	switch {
+	case !e.isMap:
+	case e.verdict:
+		regs.verdict = v.verdict
+	default:
+		regs.store(e.dreg, v.data)
+	}
+}
@@ -0,0 +1,444 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netfilter provides a NETLINK_NETFILTER socket protocol that
+// implements the nf_tables subsystem, as used by nft(8) and iptables-nft(8).
+package netfilter
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// maxDumpMessageSize is the size above which set elements are split across
+// several messages.
+const maxDumpMessageSize = 32 << 10
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct {
+	// mu protects tx.
+	mu sync.Mutex `state:"nosave"`
+
+	// tx is the transaction of the batch being received, or nil outside of
+	// batches.
+	tx *transaction
+}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_NETFILTER netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_NETFILTER
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	hdr := msg.Header()
+	var nfgen linux.NetfilterGenMessage
+	attrsView, ok := msg.GetData(&nfgen)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	a, err := parseAttrs(attrsView)
+	if err != nil {
+		return err
+	}
+
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return syserr.ErrNotSupported
+	}
+	rs := rulesetOf(t.NetworkNamespace())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch hdr.Type {
+	case linux.NFNL_MSG_BATCH_BEGIN:
+		if err := checkWriter(ctx); err != nil {
+			return err
+		}
+		if res := socket.Ntohs(nfgen.ResourceID); res != 0 && res != linux.NFNL_SUBSYS_NFTABLES {
+			return syserr.ErrInvalidArgument
+		}
+		// An unterminated batch is aborted by the next one.
+		p.tx = rs.begin()
+		if genID, ok := a.uint32(linux.NFNL_BATCH_GENID); ok && genID != p.tx.genID {
+			p.tx.failed = true
+			return syserr.ErrShouldRestart
+		}
+		return nil
+	case linux.NFNL_MSG_BATCH_END:
+		tx := p.tx
+		p.tx = nil
+		if tx == nil {
+			return syserr.ErrInvalidArgument
+		}
+		if tx.failed {
+			return nil
+		}
+		stk, err := netstackFromContext(ctx)
+		if err != nil {
+			return err
+		}
+		return rs.commit(stk.Stack, tx)
+	}
+
+	if hdr.Type>>8 != linux.NFNL_SUBSYS_NFTABLES {
+		return syserr.ErrNotSupported
+	}
+	typ := hdr.Type & 0xff
+	req := &request{flags: hdr.Flags, family: nfgen.Family, attrs: a}
+	switch typ {
+	case linux.NFT_MSG_GETTABLE, linux.NFT_MSG_GETCHAIN, linux.NFT_MSG_GETRULE, linux.NFT_MSG_GETSET, linux.NFT_MSG_GETSETELEM:
+		return p.get(rs, typ, req, ms)
+	case linux.NFT_MSG_GETGEN:
+		rs.mu.Lock()
+		genID := rs.genID
+		rs.mu.Unlock()
+		var b attrBuilder
+		b.putUint32(linux.NFTA_GEN_ID, genID)
+		b.putUint32(linux.NFTA_GEN_PROC_PID, uint32(t.PIDNamespace().IDOfThreadGroup(t.ThreadGroup())))
+		b.putString(linux.NFTA_GEN_PROC_NAME, t.Name())
+		putMessage(ms, linux.NFT_MSG_NEWGEN, linux.NFPROTO_UNSPEC, genID, b)
+		return nil
+	}
+
+	// The remaining messages change the ruleset, which is only possible in
+	// batches.
+	if err := checkWriter(ctx); err != nil {
+		return err
+	}
+	if p.tx == nil {
+		return syserr.ErrNotSupported
+	}
+	if err := p.tx.apply(typ, req); err != nil {
+		p.tx.failed = true
+		return err
+	}
+	return nil
+}
+
+// checkWriter returns an error if the task of ctx may not change the
+// ruleset.
+func checkWriter(ctx context.Context) *syserr.Error {
+	if !auth.CredentialsFromContext(ctx).HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrPermissionDenied
+	}
+	return nil
+}
+
+// netstackFromContext returns the netstack of ctx. nf_tables is only
+// supported with netstack.
+func netstackFromContext(ctx context.Context) (*netstack.Stack, *syserr.Error) {
+	stk, ok := inet.StackFromContext(ctx).(*netstack.Stack)
+	if !ok {
+		return nil, syserr.ErrNotSupported
+	}
+	return stk, nil
+}
+
+// apply applies a change to tx.
+func (tx *transaction) apply(typ uint16, req *request) *syserr.Error {
+	switch typ {
+	case linux.NFT_MSG_NEWTABLE:
+		return tx.newTable(req)
+	case linux.NFT_MSG_DELTABLE:
+		return tx.delTable(req)
+	case linux.NFT_MSG_NEWCHAIN:
+		return tx.newChain(req)
+	case linux.NFT_MSG_DELCHAIN:
+		return tx.delChain(req)
+	case linux.NFT_MSG_NEWRULE:
+		return tx.newRule(req)
+	case linux.NFT_MSG_DELRULE:
+		return tx.delRule(req)
+	case linux.NFT_MSG_NEWSET:
+		return tx.newSet(req)
+	case linux.NFT_MSG_DELSET:
+		return tx.delSet(req)
+	case linux.NFT_MSG_NEWSETELEM:
+		return tx.newSetElem(req)
+	case linux.NFT_MSG_DELSETELEM:
+		return tx.delSetElem(req)
+	default:
+		return syserr.ErrNotSupported
+	}
+}
+
+// putMessage adds a NFT_MSG_* message of type typ to ms.
+func putMessage(ms *netlink.MessageSet, typ uint16, family uint8, genID uint32, b attrBuilder) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.NFNL_SUBSYS_NFTABLES<<8 | typ,
+	})
+	m.Put(&linux.NetfilterGenMessage{
+		Family:     family,
+		Version:    linux.NFNETLINK_V0,
+		ResourceID: socket.Htons(uint16(genID)),
+	})
+	m.Put(primitive.AsByteSlice(b))
+}
+
+// get handles NFT_MSG_GET* requests, which dump the committed ruleset.
+func (p *Protocol) get(rs *ruleset, typ uint16, req *request, ms *netlink.MessageSet) *syserr.Error {
+	// Committed tables are immutable, so they can be dumped without
+	// holding rs.mu.
+	rs.mu.Lock()
+	tables := rs.tables
+	genID := rs.genID
+	rs.mu.Unlock()
+
+	dump := req.flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+	ms.Multi = dump
+	if !dump {
+		return p.getOne(tables, genID, typ, req, ms)
+	}
+	for _, t := range tables {
+		if req.family != linux.NFPROTO_UNSPEC && t.family != req.family {
+			continue
+		}
+		switch typ {
+		case linux.NFT_MSG_GETTABLE:
+			putMessage(ms, linux.NFT_MSG_NEWTABLE, t.family, genID, t.dump())
+		case linux.NFT_MSG_GETCHAIN:
+			for _, c := range t.chains {
+				putMessage(ms, linux.NFT_MSG_NEWCHAIN, t.family, genID, t.dumpChain(c))
+			}
+		case linux.NFT_MSG_GETRULE:
+			for _, c := range t.chains {
+				if name, ok := req.attrs.string(linux.NFTA_RULE_CHAIN); ok && name != c.name {
+					continue
+				}
+				for i := range c.rules {
+					putMessage(ms, linux.NFT_MSG_NEWRULE, t.family, genID, t.dumpRule(c, i))
+				}
+			}
+		case linux.NFT_MSG_GETSET:
+			for _, s := range t.sets {
+				putMessage(ms, linux.NFT_MSG_NEWSET, t.family, genID, t.dumpSet(s))
+			}
+		case linux.NFT_MSG_GETSETELEM:
+			// Set elements are dumped for a single set.
+			if name, ok := req.attrs.string(linux.NFTA_SET_ELEM_LIST_TABLE); !ok || name != t.name {
+				continue
+			}
+			name, _ := req.attrs.string(linux.NFTA_SET_ELEM_LIST_SET)
+			s := t.set(name)
+			if s == nil {
+				return syserr.ErrNoFileOrDir
+			}
+			for _, b := range t.dumpSetElems(s) {
+				putMessage(ms, linux.NFT_MSG_NEWSETELEM, t.family, genID, b)
+			}
+		}
+	}
+	return nil
+}
+
+// getOne handles NFT_MSG_GET* requests for a single object.
+func (p *Protocol) getOne(tables []*table, genID uint32, typ uint16, req *request, ms *netlink.MessageSet) *syserr.Error {
+	var tableAttr uint16
+	switch typ {
+	case linux.NFT_MSG_GETTABLE:
+		tableAttr = linux.NFTA_TABLE_NAME
+	case linux.NFT_MSG_GETCHAIN:
+		tableAttr = linux.NFTA_CHAIN_TABLE
+	case linux.NFT_MSG_GETRULE:
+		tableAttr = linux.NFTA_RULE_TABLE
+	case linux.NFT_MSG_GETSET:
+		tableAttr = linux.NFTA_SET_TABLE
+	default:
+		return syserr.ErrNotSupported
+	}
+	name, ok := req.attrs.string(tableAttr)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	t := findTable(tables, req.family, name)
+	if t == nil {
+		return syserr.ErrNoFileOrDir
+	}
+	switch typ {
+	case linux.NFT_MSG_GETTABLE:
+		putMessage(ms, linux.NFT_MSG_NEWTABLE, t.family, genID, t.dump())
+	case linux.NFT_MSG_GETCHAIN:
+		name, _ := req.attrs.string(linux.NFTA_CHAIN_NAME)
+		c := t.chain(name)
+		if c == nil {
+			return syserr.ErrNoFileOrDir
+		}
+		putMessage(ms, linux.NFT_MSG_NEWCHAIN, t.family, genID, t.dumpChain(c))
+	case linux.NFT_MSG_GETRULE:
+		name, _ := req.attrs.string(linux.NFTA_RULE_CHAIN)
+		c := t.chain(name)
+		if c == nil {
+			return syserr.ErrNoFileOrDir
+		}
+		h, ok := req.attrs.uint64(linux.NFTA_RULE_HANDLE)
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		i := c.index(h)
+		if i < 0 {
+			return syserr.ErrNoFileOrDir
+		}
+		putMessage(ms, linux.NFT_MSG_NEWRULE, t.family, genID, t.dumpRule(c, i))
+	case linux.NFT_MSG_GETSET:
+		name, _ := req.attrs.string(linux.NFTA_SET_NAME)
+		s := t.set(name)
+		if s == nil {
+			return syserr.ErrNoFileOrDir
+		}
+		putMessage(ms, linux.NFT_MSG_NEWSET, t.family, genID, t.dumpSet(s))
+	}
+	return nil
+}
+
+// dump returns the attributes of t.
+func (t *table) dump() attrBuilder {
+	var b attrBuilder
+	b.putString(linux.NFTA_TABLE_NAME, t.name)
+	b.putUint32(linux.NFTA_TABLE_FLAGS, t.flags)
+	b.putUint32(linux.NFTA_TABLE_USE, t.use())
+	b.putUint64(linux.NFTA_TABLE_HANDLE, t.handle)
+	if t.userdata != nil {
+		b.put(linux.NFTA_TABLE_USERDATA, t.userdata)
+	}
+	return b
+}
+
+// dumpChain returns the attributes of c.
+func (t *table) dumpChain(c *chain) attrBuilder {
+	var b attrBuilder
+	b.putString(linux.NFTA_CHAIN_TABLE, t.name)
+	b.putUint64(linux.NFTA_CHAIN_HANDLE, c.handle)
+	b.putString(linux.NFTA_CHAIN_NAME, c.name)
+	if c.hook != nil {
+		var hook attrBuilder
+		hook.putUint32(linux.NFTA_HOOK_HOOKNUM, c.hook.hooknum)
+		hook.putUint32(linux.NFTA_HOOK_PRIORITY, uint32(c.hook.priority))
+		b.putNested(linux.NFTA_CHAIN_HOOK, hook)
+		b.putUint32(linux.NFTA_CHAIN_POLICY, c.policy)
+		b.putString(linux.NFTA_CHAIN_TYPE, c.hook.typ)
+		b.putUint32(linux.NFTA_CHAIN_FLAGS, linux.NFT_CHAIN_BASE)
+		if c.counters != nil {
+			var counters attrBuilder
+			counters.putUint64(linux.NFTA_COUNTER_BYTES, c.counters.bytes.Load())
+			counters.putUint64(linux.NFTA_COUNTER_PACKETS, c.counters.packets.Load())
+			b.putNested(linux.NFTA_CHAIN_COUNTERS, counters)
+		}
+	}
+	b.putUint32(linux.NFTA_CHAIN_USE, t.chainUse(c.name))
+	if c.userdata != nil {
+		b.put(linux.NFTA_CHAIN_USERDATA, c.userdata)
+	}
+	return b
+}
+
+// dumpRule returns the attributes of the ith rule of c.
+func (t *table) dumpRule(c *chain, i int) attrBuilder {
+	r := c.rules[i]
+	var b attrBuilder
+	b.putString(linux.NFTA_RULE_TABLE, t.name)
+	b.putString(linux.NFTA_RULE_CHAIN, c.name)
+	b.putUint64(linux.NFTA_RULE_HANDLE, r.handle)
+	if i > 0 {
+		b.putUint64(linux.NFTA_RULE_POSITION, c.rules[i-1].handle)
+	}
+	b.putNested(linux.NFTA_RULE_EXPRESSIONS, dumpExprs(r.exprs))
+	if r.userdata != nil {
+		b.put(linux.NFTA_RULE_USERDATA, r.userdata)
+	}
+	return b
+}
+
+// dumpSet returns the attributes of s.
+func (t *table) dumpSet(s *set) attrBuilder {
+	var b attrBuilder
+	b.putString(linux.NFTA_SET_TABLE, t.name)
+	b.putString(linux.NFTA_SET_NAME, s.name)
+	b.putUint64(linux.NFTA_SET_HANDLE, s.handle)
+	b.putUint32(linux.NFTA_SET_FLAGS, s.flags)
+	b.putUint32(linux.NFTA_SET_KEY_TYPE, s.keyType)
+	b.putUint32(linux.NFTA_SET_KEY_LEN, uint32(s.keyLen))
+	if s.isMap() {
+		b.putUint32(linux.NFTA_SET_DATA_TYPE, s.dataType)
+		b.putUint32(linux.NFTA_SET_DATA_LEN, uint32(s.dataLen))
+	}
+	if s.hasPolicy {
+		b.putUint32(linux.NFTA_SET_POLICY, s.policy)
+	}
+	if s.desc != nil {
+		b.put(linux.NFTA_SET_DESC, s.desc)
+	}
+	if s.userdata != nil {
+		b.put(linux.NFTA_SET_USERDATA, s.userdata)
+	}
+	return b
+}
+
+// dumpSetElems returns the attributes of the elements of s, split into
+// messages.
+func (t *table) dumpSetElems(s *set) []attrBuilder {
+	var msgs []attrBuilder
+	var elems attrBuilder
+	flush := func() {
+		var b attrBuilder
+		b.putString(linux.NFTA_SET_ELEM_LIST_TABLE, t.name)
+		b.putString(linux.NFTA_SET_ELEM_LIST_SET, s.name)
+		if len(elems) != 0 {
+			b.putNested(linux.NFTA_SET_ELEM_LIST_ELEMENTS, elems)
+		}
+		msgs = append(msgs, b)
+		elems = nil
+	}
+	for i := range s.elems {
+		var el attrBuilder
+		s.elems[i].dump(&el)
+		elems.putNested(linux.NFTA_LIST_ELEM, el)
+		if len(elems) >= maxDumpMessageSize {
+			flush()
+		}
+	}
+	if len(elems) != 0 || len(msgs) == 0 {
+		flush()
+	}
+	return msgs
+}
+
+// init registers the NETLINK_NETFILTER provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_NETFILTER, NewProtocol)
+}
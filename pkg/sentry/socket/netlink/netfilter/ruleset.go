@@ -0,0 +1,382 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// ruleset is the nftables ruleset of a network namespace.
+//
+// +stateify savable
+type ruleset struct {
+	// mu serializes commits and protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// genID is the generation of the ruleset. It is incremented by each
+	// committed batch.
+	genID uint32
+
+	// tables are the tables of the ruleset, in the order they were added.
+	// Committed tables are never modified: transactions work on copies.
+	tables []*table
+
+	// tableHandle is the last handle allocated to a table.
+	tableHandle uint64
+
+	// owned[v6][id] is true if netstack's table id is compiled from the
+	// ruleset, in which case legacy[v6][id] is the table it replaced. These
+	// describe the state of netstack, so they aren't saved; a restored
+	// ruleset is installed again by the next committed batch.
+	owned  [2][stack.NumTables]bool        `state:"nosave"`
+	legacy [2][stack.NumTables]stack.Table `state:"nosave"`
+}
+
+// rulesetOf returns the ruleset of ns.
+func rulesetOf(ns *inet.Namespace) *ruleset {
+	return ns.NFTables(func() interface{} {
+		// Generations start at 1, as in Linux.
+		return &ruleset{genID: 1}
+	}).(*ruleset)
+}
+
+// table is an nftables table.
+//
+// +stateify savable
+type table struct {
+	// family is the NFPROTO_* family of the table.
+	family uint8
+	name   string
+	handle uint64
+
+	// flags are NFT_TABLE_F_* flags.
+	flags    uint32
+	userdata []byte
+
+	// chains and sets are in the order they were added.
+	chains []*chain
+	sets   []*set
+
+	// hgen is the last handle allocated to a chain, rule or set of the
+	// table.
+	hgen uint64
+}
+
+// chain is an nftables chain.
+//
+// +stateify savable
+type chain struct {
+	name   string
+	handle uint64
+
+	// hook is the hook of a base chain. It is nil for regular chains.
+	hook *chainHook
+
+	// policy is the verdict of a base chain for packets that reach its end,
+	// NF_ACCEPT or NF_DROP.
+	policy uint32
+
+	// counters counts the packets that a base chain applied its policy to.
+	// It is nil if the chain was created without counters. It is shared by
+	// all copies of the chain.
+	counters *chainCounters
+
+	userdata []byte
+	rules    []*rule
+}
+
+// chainHook is the hook of a base chain.
+//
+// +stateify savable
+type chainHook struct {
+	// hooknum is the NF_INET_* hook.
+	hooknum  uint32
+	priority int32
+
+	// typ is the chain type: "filter", "nat" or "route".
+	typ string
+}
+
+// chainCounters are the policy counters of a base chain.
+//
+// +stateify savable
+type chainCounters struct {
+	packets atomicbitops.Uint64
+	bytes   atomicbitops.Uint64
+}
+
+// rule is an nftables rule. Rules are immutable, except for the counters of
+// their expressions, so they are shared by copies of their chain.
+//
+// +stateify savable
+type rule struct {
+	handle   uint64
+	exprs    []expr
+	userdata []byte
+}
+
+// validFamily returns whether tables of family are supported.
+func validFamily(family uint8) bool {
+	switch family {
+	case linux.NFPROTO_IPV4, linux.NFPROTO_IPV6, linux.NFPROTO_INET:
+		return true
+	default:
+		return false
+	}
+}
+
+// findTable returns the table of tables with the given family and name, or
+// nil if there is none.
+func findTable(tables []*table, family uint8, name string) *table {
+	for _, t := range tables {
+		if t.family == family && t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// clone returns a copy of t that can be modified without affecting t.
+func (t *table) clone() *table {
+	nt := *t
+	nt.chains = make([]*chain, len(t.chains))
+	for i, c := range t.chains {
+		nc := *c
+		nc.rules = append([]*rule(nil), c.rules...)
+		nt.chains[i] = &nc
+	}
+	nt.sets = make([]*set, len(t.sets))
+	for i, s := range t.sets {
+		ns := *s
+		ns.elems = append([]setElem(nil), s.elems...)
+		nt.sets[i] = &ns
+	}
+	return &nt
+}
+
+// nextHandle allocates a handle for a chain, rule or set of t.
+func (t *table) nextHandle() uint64 {
+	t.hgen++
+	return t.hgen
+}
+
+// chain returns the chain of t with the given name, or nil.
+func (t *table) chain(name string) *chain {
+	for _, c := range t.chains {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// chainByHandle returns the chain of t with the given handle, or nil.
+func (t *table) chainByHandle(handle uint64) *chain {
+	for _, c := range t.chains {
+		if c.handle == handle {
+			return c
+		}
+	}
+	return nil
+}
+
+// removeChain removes c from t.
+func (t *table) removeChain(c *chain) {
+	for i, tc := range t.chains {
+		if tc == c {
+			t.chains = append(t.chains[:i], t.chains[i+1:]...)
+			return
+		}
+	}
+}
+
+// set returns the set of t with the given name, or nil.
+func (t *table) set(name string) *set {
+	for _, s := range t.sets {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// setByHandle returns the set of t with the given handle, or nil.
+func (t *table) setByHandle(handle uint64) *set {
+	for _, s := range t.sets {
+		if s.handle == handle {
+			return s
+		}
+	}
+	return nil
+}
+
+// removeSet removes s from t.
+func (t *table) removeSet(s *set) {
+	for i, ts := range t.sets {
+		if ts == s {
+			t.sets = append(t.sets[:i], t.sets[i+1:]...)
+			return
+		}
+	}
+}
+
+// use returns the number of objects in t, as reported in NFTA_TABLE_USE.
+func (t *table) use() uint32 {
+	return uint32(len(t.chains) + len(t.sets))
+}
+
+// chainUse returns the number of references to the chain named name, from
+// jump verdicts of rules and of set elements.
+func (t *table) chainUse(name string) uint32 {
+	var use uint32
+	for _, c := range t.chains {
+		for _, r := range c.rules {
+			for _, e := range r.exprs {
+				if im, ok := e.(*immediateExpr); ok && im.data.jumpsTo(name) {
+					use++
+				}
+			}
+		}
+	}
+	for _, s := range t.sets {
+		for i := range s.elems {
+			if s.elems[i].data.jumpsTo(name) {
+				use++
+			}
+		}
+	}
+	return use
+}
+
+// setUse returns the number of lookups of the set named name.
+func (t *table) setUse(name string) uint32 {
+	var use uint32
+	for _, c := range t.chains {
+		for _, r := range c.rules {
+			for _, e := range r.exprs {
+				if l, ok := e.(*lookupExpr); ok && l.set == name {
+					use++
+				}
+			}
+		}
+	}
+	return use
+}
+
+// jumps calls fn with the name of each chain that r may jump to.
+func (t *table) jumps(r *rule, fn func(name string)) {
+	for _, e := range r.exprs {
+		switch e := e.(type) {
+		case *immediateExpr:
+			if e.data.isVerdict && e.data.verdict.code == linux.NFT_JUMP {
+				fn(e.data.verdict.chain)
+			}
+		case *lookupExpr:
+			if !e.verdict {
+				continue
+			}
+			if s := t.set(e.set); s != nil {
+				for i := range s.elems {
+					if d := &s.elems[i].data; d.isVerdict && d.verdict.code == linux.NFT_JUMP {
+						fn(d.verdict.chain)
+					}
+				}
+			}
+		}
+	}
+}
+
+// reachable returns the regular chains that may be jumped to from c,
+// directly or indirectly, in the order they are first reached. It returns
+// ELOOP if c may jump to itself.
+func (t *table) reachable(c *chain) ([]*chain, *syserr.Error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := map[*chain]int{c: visiting}
+	var order []*chain
+	var visit func(c *chain) *syserr.Error
+	visit = func(c *chain) *syserr.Error {
+		var err *syserr.Error
+		for _, r := range c.rules {
+			t.jumps(r, func(name string) {
+				target := t.chain(name)
+				if err != nil || target == nil {
+					return
+				}
+				switch state[target] {
+				case visiting:
+					err = syserr.ErrLinkLoop
+					return
+				case visited:
+					return
+				}
+				state[target] = visiting
+				order = append(order, target)
+				if err = visit(target); err == nil {
+					state[target] = visited
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(c); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// releaseRule deletes the anonymous sets that were only used by r, which was
+// removed from t.
+func (t *table) releaseRule(r *rule) {
+	for _, e := range r.exprs {
+		l, ok := e.(*lookupExpr)
+		if !ok {
+			continue
+		}
+		if s := t.set(l.set); s != nil && s.flags&linux.NFT_SET_ANONYMOUS != 0 && t.setUse(s.name) == 0 {
+			t.removeSet(s)
+		}
+	}
+}
+
+// index returns the index of the rule of c with the given handle, or -1.
+func (c *chain) index(handle uint64) int {
+	for i, r := range c.rules {
+		if r.handle == handle {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOf returns the index of r in c, or -1.
+func (c *chain) indexOf(r *rule) int {
+	for i, cr := range c.rules {
+		if cr == r {
+			return i
+		}
+	}
+	return -1
+}
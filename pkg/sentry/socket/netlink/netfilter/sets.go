@@ -0,0 +1,245 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"bytes"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// set is an nftables set or map.
+//
+// +stateify savable
+type set struct {
+	name   string
+	handle uint64
+
+	// flags are NFT_SET_* flags.
+	flags uint32
+
+	// keyType and dataType are opaque to the kernel; they describe the data
+	// to userspace.
+	keyType  uint32
+	keyLen   int
+	dataType uint32
+	dataLen  int
+
+	// policy is the NFTA_SET_POLICY attribute, if hasPolicy. It is only a
+	// hint.
+	policy    uint32
+	hasPolicy bool
+
+	// desc is the raw NFTA_SET_DESC attribute, if any. It is only a hint.
+	desc []byte
+
+	userdata []byte
+
+	// elems are the elements of the set. Elements of interval sets are the
+	// boundaries of the intervals.
+	elems []setElem
+}
+
+// setElem is an element of a set.
+//
+// +stateify savable
+type setElem struct {
+	key []byte
+
+	// flags are NFT_SET_ELEM_* flags.
+	flags uint32
+
+	// data is the data that the key maps to, for maps.
+	data     data
+	userdata []byte
+}
+
+// unsupportedSetFlags are the NFT_SET_* flags of sets that aren't
+// supported.
+const unsupportedSetFlags = linux.NFT_SET_TIMEOUT | linux.NFT_SET_EVAL | linux.NFT_SET_OBJECT | linux.NFT_SET_EXPR
+
+// isMap returns whether s is a map.
+func (s *set) isMap() bool {
+	return s.flags&linux.NFT_SET_MAP != 0
+}
+
+// elem returns the index of the element of s with the given key and
+// NFT_SET_ELEM_INTERVAL_END flag, or -1.
+func (s *set) elem(key []byte, flags uint32) int {
+	for i := range s.elems {
+		el := &s.elems[i]
+		if bytes.Equal(el.key, key) && el.flags&linux.NFT_SET_ELEM_INTERVAL_END == flags&linux.NFT_SET_ELEM_INTERVAL_END {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseSetElem parses an element of s.
+func parseSetElem(ec *exprContext, s *set, b []byte) (setElem, *syserr.Error) {
+	a, err := parseAttrs(b)
+	if err != nil {
+		return setElem{}, err
+	}
+	switch {
+	case a.has(linux.NFTA_SET_ELEM_KEY_END), a.has(linux.NFTA_SET_ELEM_TIMEOUT), a.has(linux.NFTA_SET_ELEM_EXPIRATION), a.has(linux.NFTA_SET_ELEM_EXPR), a.has(linux.NFTA_SET_ELEM_EXPRESSIONS), a.has(linux.NFTA_SET_ELEM_OBJREF):
+		return setElem{}, syserr.ErrNotSupported
+	}
+	var el setElem
+	el.flags, _ = a.uint32(linux.NFTA_SET_ELEM_FLAGS)
+	if el.flags&linux.NFT_SET_ELEM_CATCHALL != 0 {
+		return setElem{}, syserr.ErrNotSupported
+	}
+	if el.flags&^linux.NFT_SET_ELEM_INTERVAL_END != 0 {
+		return setElem{}, syserr.ErrInvalidArgument
+	}
+	if el.flags&linux.NFT_SET_ELEM_INTERVAL_END != 0 && s.flags&linux.NFT_SET_INTERVAL == 0 {
+		return setElem{}, syserr.ErrInvalidArgument
+	}
+	if !a.has(linux.NFTA_SET_ELEM_KEY) {
+		return setElem{}, syserr.ErrInvalidArgument
+	}
+	if el.key, err = parseValue(a[linux.NFTA_SET_ELEM_KEY]); err != nil {
+		return setElem{}, err
+	}
+	if len(el.key) != s.keyLen {
+		return setElem{}, syserr.ErrInvalidArgument
+	}
+	if v, ok := a[linux.NFTA_SET_ELEM_USERDATA]; ok {
+		if len(v) > linux.NFT_USERDATA_MAXLEN {
+			return setElem{}, syserr.ErrInvalidArgument
+		}
+		el.userdata = append([]byte(nil), v...)
+	}
+	// Elements that end intervals don't map to data.
+	wantData := s.isMap() && el.flags&linux.NFT_SET_ELEM_INTERVAL_END == 0
+	if a.has(linux.NFTA_SET_ELEM_DATA) != wantData {
+		return setElem{}, syserr.ErrInvalidArgument
+	}
+	if !wantData {
+		return el, nil
+	}
+	if el.data, err = parseData(ec, a[linux.NFTA_SET_ELEM_DATA]); err != nil {
+		return setElem{}, err
+	}
+	if el.data.isVerdict != (s.dataType == linux.NFT_DATA_VERDICT) || (!el.data.isVerdict && el.data.len() != s.dataLen) {
+		return setElem{}, syserr.ErrInvalidArgument
+	}
+	return el, nil
+}
+
+// dump adds el to b.
+func (el *setElem) dump(b *attrBuilder) {
+	(&data{value: el.key}).dump(b, linux.NFTA_SET_ELEM_KEY)
+	if el.data.isVerdict || el.data.value != nil {
+		el.data.dump(b, linux.NFTA_SET_ELEM_DATA)
+	}
+	if el.flags != 0 {
+		b.putUint32(linux.NFTA_SET_ELEM_FLAGS, el.flags)
+	}
+	if el.userdata != nil {
+		b.put(linux.NFTA_SET_ELEM_USERDATA, el.userdata)
+	}
+}
+
+// setValue is the data that an element of a compiled map maps to.
+type setValue struct {
+	data    []byte
+	verdict boundVerdict
+}
+
+// intervalElem is an element of a compiled interval set.
+type intervalElem struct {
+	key []byte
+
+	// end is true if the element ends an interval rather than starting one.
+	end   bool
+	value setValue
+}
+
+// compiledSet is a set as compiled for lookups.
+type compiledSet struct {
+	// interval is true for interval sets, which use intervals rather than
+	// elems.
+	interval bool
+
+	// elems maps keys to values.
+	elems map[string]setValue
+
+	// intervals are the elements of an interval set, sorted by key. The
+	// interval that an element starts extends up to the next element.
+	intervals []intervalElem
+}
+
+// compileSet compiles s in the context of c.
+func compileSet(c *compileContext, s *set) *compiledSet {
+	bind := func(el *setElem) setValue {
+		v := setValue{data: el.data.value}
+		if el.data.isVerdict {
+			v.verdict = c.bind(el.data.verdict)
+		}
+		return v
+	}
+	cs := &compiledSet{interval: s.flags&linux.NFT_SET_INTERVAL != 0}
+	if !cs.interval {
+		cs.elems = make(map[string]setValue, len(s.elems))
+		for i := range s.elems {
+			el := &s.elems[i]
+			cs.elems[string(el.key)] = bind(el)
+		}
+		return cs
+	}
+	cs.intervals = make([]intervalElem, 0, len(s.elems))
+	for i := range s.elems {
+		el := &s.elems[i]
+		cs.intervals = append(cs.intervals, intervalElem{
+			key:   el.key,
+			end:   el.flags&linux.NFT_SET_ELEM_INTERVAL_END != 0,
+			value: bind(el),
+		})
+	}
+	// An interval may start where the previous one ends, so ends sort first.
+	sort.Slice(cs.intervals, func(i, j int) bool {
+		if c := bytes.Compare(cs.intervals[i].key, cs.intervals[j].key); c != 0 {
+			return c < 0
+		}
+		return cs.intervals[i].end && !cs.intervals[j].end
+	})
+	return cs
+}
+
+// lookup returns the value that key maps to, and whether key is in the set.
+func (cs *compiledSet) lookup(key []byte) (setValue, bool) {
+	if !cs.interval {
+		v, ok := cs.elems[string(key)]
+		return v, ok
+	}
+	// Find the last element whose key is at most key.
+	lo, hi := 0, len(cs.intervals)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if bytes.Compare(cs.intervals[mid].key, key) <= 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 || cs.intervals[lo-1].end {
+		return setValue{}, false
+	}
+	return cs.intervals[lo-1].value, true
+}
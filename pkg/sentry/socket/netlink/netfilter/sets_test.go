@@ -0,0 +1,108 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"bytes"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+func TestAttrsRoundTrip(t *testing.T) {
+	var nested attrBuilder
+	nested.putUint32(linux.NFTA_HOOK_HOOKNUM, linux.NF_INET_LOCAL_IN)
+	var b attrBuilder
+	b.putString(linux.NFTA_CHAIN_NAME, "input")
+	b.putUint64(linux.NFTA_CHAIN_HANDLE, 42)
+	b.putNested(linux.NFTA_CHAIN_HOOK, nested)
+
+	a, err := parseAttrs(b)
+	if err != nil {
+		t.Fatalf("parseAttrs failed: %v", err)
+	}
+	if name, ok := a.string(linux.NFTA_CHAIN_NAME); !ok || name != "input" {
+		t.Errorf("got name %q, %t; want %q, true", name, ok, "input")
+	}
+	if h, ok := a.uint64(linux.NFTA_CHAIN_HANDLE); !ok || h != 42 {
+		t.Errorf("got handle %d, %t; want 42, true", h, ok)
+	}
+	if _, ok := a.uint32(linux.NFTA_CHAIN_HANDLE); ok {
+		t.Errorf("got 64-bit attribute as 32-bit value")
+	}
+	ha, ok, err := a.nested(linux.NFTA_CHAIN_HOOK)
+	if err != nil || !ok {
+		t.Fatalf("got nested = %t, %v; want true, nil", ok, err)
+	}
+	if hooknum, ok := ha.uint32(linux.NFTA_HOOK_HOOKNUM); !ok || hooknum != linux.NF_INET_LOCAL_IN {
+		t.Errorf("got hooknum %d, %t; want %d, true", hooknum, ok, linux.NF_INET_LOCAL_IN)
+	}
+}
+
+func TestIntervalSetLookup(t *testing.T) {
+	// The set contains [10, 20), [20, 30) and [40, 255].
+	s := &set{
+		flags:  linux.NFT_SET_INTERVAL,
+		keyLen: 1,
+		elems: []setElem{
+			{key: []byte{40}},
+			{key: []byte{20}},
+			{key: []byte{30}, flags: linux.NFT_SET_ELEM_INTERVAL_END},
+			{key: []byte{20}, flags: linux.NFT_SET_ELEM_INTERVAL_END},
+			{key: []byte{10}},
+			{key: []byte{0}, flags: linux.NFT_SET_ELEM_INTERVAL_END},
+		},
+	}
+	cs := compileSet(&compileContext{}, s)
+	for _, test := range []struct {
+		key  byte
+		want bool
+	}{
+		{key: 0, want: false},
+		{key: 9, want: false},
+		{key: 10, want: true},
+		{key: 19, want: true},
+		{key: 20, want: true},
+		{key: 29, want: true},
+		{key: 30, want: false},
+		{key: 39, want: false},
+		{key: 40, want: true},
+		{key: 255, want: true},
+	} {
+		if _, ok := cs.lookup([]byte{test.key}); ok != test.want {
+			t.Errorf("lookup(%d) = %t, want %t", test.key, ok, test.want)
+		}
+	}
+}
+
+func TestMapLookup(t *testing.T) {
+	s := &set{
+		flags:    linux.NFT_SET_MAP,
+		keyLen:   2,
+		dataType: 1,
+		dataLen:  1,
+		elems: []setElem{
+			{key: []byte{0, 80}, data: data{value: []byte{1}}},
+			{key: []byte{1, 187}, data: data{value: []byte{2}}},
+		},
+	}
+	cs := compileSet(&compileContext{}, s)
+	if v, ok := cs.lookup([]byte{1, 187}); !ok || !bytes.Equal(v.data, []byte{2}) {
+		t.Errorf("got lookup = %v, %t; want [2], true", v.data, ok)
+	}
+	if _, ok := cs.lookup([]byte{0, 81}); ok {
+		t.Errorf("got lookup of missing key = true, want false")
+	}
+}
@@ -0,0 +1,713 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// transaction is a batch of changes to a ruleset, which are applied to a copy
+// of the ruleset and committed together.
+//
+// +stateify savable
+type transaction struct {
+	// genID is the generation of the ruleset that the transaction applies
+	// to.
+	genID uint32
+
+	tables      []*table
+	tableHandle uint64
+
+	// failed is true if a change failed, in which case the transaction is
+	// aborted.
+	failed bool
+
+	// The objects created by the transaction, by the IDs that userspace
+	// assigned them so that later changes of the batch can refer to them.
+	chainIDs map[uint32]*chain
+	ruleIDs  map[uint32]*rule
+	setIDs   map[uint32]*set
+}
+
+// begin starts a transaction on rs.
+func (rs *ruleset) begin() *transaction {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	tx := &transaction{
+		genID:       rs.genID,
+		tables:      make([]*table, len(rs.tables)),
+		tableHandle: rs.tableHandle,
+		chainIDs:    make(map[uint32]*chain),
+		ruleIDs:     make(map[uint32]*rule),
+		setIDs:      make(map[uint32]*set),
+	}
+	for i, t := range rs.tables {
+		tx.tables[i] = t.clone()
+	}
+	return tx
+}
+
+// commit compiles the tables of tx into the netstack tables of stk, and makes
+// them the tables of rs. It fails with ERESTART if rs changed since tx began.
+func (rs *ruleset) commit(stk *stack.Stack, tx *transaction) *syserr.Error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if tx.genID != rs.genID {
+		return syserr.ErrShouldRestart
+	}
+	var (
+		compiled [2][stack.NumTables]stack.Table
+		ok       [2][stack.NumTables]bool
+	)
+	for v := range compiled {
+		for id := stack.TableID(0); id < stack.NumTables; id++ {
+			var err *syserr.Error
+			if compiled[v][id], ok[v][id], err = compileTables(tx.tables, id, v == 1); err != nil {
+				return err
+			}
+		}
+	}
+	it := stk.IPTables()
+	for v := range compiled {
+		ipv6 := v == 1
+		for id := stack.TableID(0); id < stack.NumTables; id++ {
+			switch {
+			case ok[v][id]:
+				if !rs.owned[v][id] {
+					rs.legacy[v][id] = it.GetTable(id, ipv6)
+					rs.owned[v][id] = true
+				}
+				it.ReplaceTable(id, compiled[v][id], ipv6)
+			case rs.owned[v][id]:
+				// Give the table back to iptables.
+				it.ReplaceTable(id, rs.legacy[v][id], ipv6)
+				rs.legacy[v][id] = stack.Table{}
+				rs.owned[v][id] = false
+			}
+		}
+	}
+	rs.tables = tx.tables
+	rs.tableHandle = tx.tableHandle
+	rs.genID++
+	return nil
+}
+
+// request is a message that changes the ruleset.
+type request struct {
+	flags  uint16
+	family uint8
+	attrs  attrs
+}
+
+// lookupTable returns the table of the request, as identified by its name
+// attribute typ or its handle attribute handleTyp if it's not 0.
+func (tx *transaction) lookupTable(req *request, typ, handleTyp uint16) (*table, *syserr.Error) {
+	if name, ok := req.attrs.string(typ); ok {
+		if t := findTable(tx.tables, req.family, name); t != nil {
+			return t, nil
+		}
+		return nil, syserr.ErrNoFileOrDir
+	}
+	if handleTyp != 0 {
+		if h, ok := req.attrs.uint64(handleTyp); ok {
+			for _, t := range tx.tables {
+				if t.family == req.family && t.handle == h {
+					return t, nil
+				}
+			}
+			return nil, syserr.ErrNoFileOrDir
+		}
+	}
+	return nil, syserr.ErrInvalidArgument
+}
+
+// userdata returns the value of the userdata attribute typ of req.
+func (req *request) userdata(typ uint16) ([]byte, *syserr.Error) {
+	v, ok := req.attrs[typ]
+	if !ok {
+		return nil, nil
+	}
+	if len(v) > linux.NFT_USERDATA_MAXLEN {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// newTable handles NFT_MSG_NEWTABLE.
+func (tx *transaction) newTable(req *request) *syserr.Error {
+	if !validFamily(req.family) {
+		return syserr.ErrAddressFamilyNotSupported
+	}
+	name, ok := req.attrs.string(linux.NFTA_TABLE_NAME)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	flags, hasFlags := req.attrs.uint32(linux.NFTA_TABLE_FLAGS)
+	if flags&^linux.NFT_TABLE_F_DORMANT != 0 {
+		return syserr.ErrNotSupported
+	}
+	if t := findTable(tx.tables, req.family, name); t != nil {
+		if req.flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		if req.flags&linux.NLM_F_REPLACE != 0 {
+			return syserr.ErrNotSupported
+		}
+		if hasFlags {
+			t.flags = flags
+		}
+		return nil
+	}
+	userdata, err := req.userdata(linux.NFTA_TABLE_USERDATA)
+	if err != nil {
+		return err
+	}
+	tx.tableHandle++
+	tx.tables = append(tx.tables, &table{
+		family:   req.family,
+		name:     name,
+		handle:   tx.tableHandle,
+		flags:    flags,
+		userdata: userdata,
+	})
+	return nil
+}
+
+// delTable handles NFT_MSG_DELTABLE. Without a table name or handle, it
+// deletes all tables of the family.
+func (tx *transaction) delTable(req *request) *syserr.Error {
+	if !req.attrs.has(linux.NFTA_TABLE_NAME) && !req.attrs.has(linux.NFTA_TABLE_HANDLE) {
+		tables := tx.tables[:0]
+		for _, t := range tx.tables {
+			if req.family != linux.NFPROTO_UNSPEC && t.family != req.family {
+				tables = append(tables, t)
+			}
+		}
+		tx.tables = tables
+		return nil
+	}
+	t, err := tx.lookupTable(req, linux.NFTA_TABLE_NAME, linux.NFTA_TABLE_HANDLE)
+	if err != nil {
+		return err
+	}
+	for i, tt := range tx.tables {
+		if tt == t {
+			tx.tables = append(tx.tables[:i], tx.tables[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// lookupChain returns the chain of the request in t, as identified by its
+// name attribute typ or its handle attribute handleTyp if it's not 0.
+func (tx *transaction) lookupChain(req *request, t *table, typ, handleTyp uint16) (*chain, *syserr.Error) {
+	var c *chain
+	if handleTyp != 0 && req.attrs.has(handleTyp) {
+		h, _ := req.attrs.uint64(handleTyp)
+		c = t.chainByHandle(h)
+	} else if name, ok := req.attrs.string(typ); ok {
+		c = t.chain(name)
+	} else {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if c == nil {
+		return nil, syserr.ErrNoFileOrDir
+	}
+	return c, nil
+}
+
+// newChain handles NFT_MSG_NEWCHAIN.
+func (tx *transaction) newChain(req *request) *syserr.Error {
+	t, err := tx.lookupTable(req, linux.NFTA_CHAIN_TABLE, 0)
+	if err != nil {
+		return err
+	}
+	var hook *chainHook
+	ha, hasHook, err := req.attrs.nested(linux.NFTA_CHAIN_HOOK)
+	if err != nil {
+		return err
+	}
+	if hasHook {
+		hooknum, ok := ha.uint32(linux.NFTA_HOOK_HOOKNUM)
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		priority, ok := ha.uint32(linux.NFTA_HOOK_PRIORITY)
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		if ha.has(linux.NFTA_HOOK_DEV) || ha.has(linux.NFTA_HOOK_DEVS) {
+			return syserr.ErrNotSupported
+		}
+		hook = &chainHook{hooknum: hooknum, priority: int32(priority), typ: "filter"}
+		if typ, ok := req.attrs.string(linux.NFTA_CHAIN_TYPE); ok {
+			hook.typ = typ
+		}
+		if _, ok := stackTable(hook.typ, hook.hooknum); !ok {
+			return syserr.ErrNotSupported
+		}
+	}
+	policy, hasPolicy := req.attrs.uint32(linux.NFTA_CHAIN_POLICY)
+	if hasPolicy && policy != linux.NF_ACCEPT && policy != linux.NF_DROP {
+		return syserr.ErrInvalidArgument
+	}
+	if flags, _ := req.attrs.uint32(linux.NFTA_CHAIN_FLAGS); flags&^linux.NFT_CHAIN_BASE != 0 {
+		return syserr.ErrNotSupported
+	}
+
+	c, err := tx.lookupChain(req, t, linux.NFTA_CHAIN_NAME, linux.NFTA_CHAIN_HANDLE)
+	switch err {
+	case nil:
+		return tx.updateChain(req, t, c, hook, policy, hasPolicy)
+	case syserr.ErrNoFileOrDir:
+		if req.attrs.has(linux.NFTA_CHAIN_HANDLE) {
+			return err
+		}
+	default:
+		return err
+	}
+
+	name, _ := req.attrs.string(linux.NFTA_CHAIN_NAME)
+	if len(name) >= linux.NFT_CHAIN_MAXNAMELEN {
+		return syserr.ErrNameTooLong
+	}
+	userdata, err := req.userdata(linux.NFTA_CHAIN_USERDATA)
+	if err != nil {
+		return err
+	}
+	c = &chain{
+		name:     name,
+		handle:   t.nextHandle(),
+		hook:     hook,
+		policy:   linux.NF_ACCEPT,
+		userdata: userdata,
+	}
+	if hook != nil {
+		if hasPolicy {
+			c.policy = policy
+		}
+		ca, ok, err := req.attrs.nested(linux.NFTA_CHAIN_COUNTERS)
+		if err != nil {
+			return err
+		}
+		if ok {
+			c.counters = &chainCounters{}
+			packets, _ := ca.uint64(linux.NFTA_COUNTER_PACKETS)
+			bytes, _ := ca.uint64(linux.NFTA_COUNTER_BYTES)
+			c.counters.packets.Store(packets)
+			c.counters.bytes.Store(bytes)
+		}
+	} else if hasPolicy {
+		return syserr.ErrNotSupported
+	}
+	t.chains = append(t.chains, c)
+	if id, ok := req.attrs.uint32(linux.NFTA_CHAIN_ID); ok {
+		tx.chainIDs[id] = c
+	}
+	return nil
+}
+
+// updateChain handles NFT_MSG_NEWCHAIN for an existing chain.
+func (tx *transaction) updateChain(req *request, t *table, c *chain, hook *chainHook, policy uint32, hasPolicy bool) *syserr.Error {
+	if req.flags&linux.NLM_F_EXCL != 0 {
+		return syserr.ErrExists
+	}
+	if req.flags&linux.NLM_F_REPLACE != 0 {
+		return syserr.ErrNotSupported
+	}
+	if hook != nil && (c.hook == nil || *hook != *c.hook) {
+		return syserr.ErrExists
+	}
+	if hasPolicy {
+		if c.hook == nil {
+			return syserr.ErrNotSupported
+		}
+		c.policy = policy
+	}
+	if name, ok := req.attrs.string(linux.NFTA_CHAIN_NAME); ok && name != c.name {
+		// Renaming is only supported for chains that aren't referenced.
+		if len(name) >= linux.NFT_CHAIN_MAXNAMELEN {
+			return syserr.ErrNameTooLong
+		}
+		if t.chain(name) != nil {
+			return syserr.ErrExists
+		}
+		if t.chainUse(c.name) != 0 {
+			return syserr.ErrNotSupported
+		}
+		c.name = name
+	}
+	return nil
+}
+
+// delChain handles NFT_MSG_DELCHAIN.
+func (tx *transaction) delChain(req *request) *syserr.Error {
+	t, err := tx.lookupTable(req, linux.NFTA_CHAIN_TABLE, 0)
+	if err != nil {
+		return err
+	}
+	c, err := tx.lookupChain(req, t, linux.NFTA_CHAIN_NAME, linux.NFTA_CHAIN_HANDLE)
+	if err != nil {
+		return err
+	}
+	if req.flags&linux.NLM_F_NONREC != 0 && len(c.rules) != 0 {
+		return syserr.ErrBusy
+	}
+	if t.chainUse(c.name) != 0 {
+		return syserr.ErrBusy
+	}
+	rules := c.rules
+	t.removeChain(c)
+	for _, r := range rules {
+		t.releaseRule(r)
+	}
+	return nil
+}
+
+// newRule handles NFT_MSG_NEWRULE.
+func (tx *transaction) newRule(req *request) *syserr.Error {
+	t, err := tx.lookupTable(req, linux.NFTA_RULE_TABLE, 0)
+	if err != nil {
+		return err
+	}
+	var c *chain
+	if id, ok := req.attrs.uint32(linux.NFTA_RULE_CHAIN_ID); ok && !req.attrs.has(linux.NFTA_RULE_CHAIN) {
+		if c = tx.chainIDs[id]; c == nil || t.chain(c.name) != c {
+			return syserr.ErrNoFileOrDir
+		}
+	} else if c, err = tx.lookupChain(req, t, linux.NFTA_RULE_CHAIN, 0); err != nil {
+		return err
+	}
+
+	// Find the rule to replace, or the position of the new rule.
+	replace := -1
+	pos := -1
+	if h, ok := req.attrs.uint64(linux.NFTA_RULE_HANDLE); ok {
+		if replace = c.index(h); replace < 0 {
+			return syserr.ErrNoFileOrDir
+		}
+		if req.flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		if req.flags&linux.NLM_F_REPLACE == 0 {
+			return syserr.ErrNotSupported
+		}
+	} else if req.flags&linux.NLM_F_REPLACE != 0 {
+		return syserr.ErrInvalidArgument
+	} else if h, ok := req.attrs.uint64(linux.NFTA_RULE_POSITION); ok {
+		if pos = c.index(h); pos < 0 {
+			return syserr.ErrNoFileOrDir
+		}
+	} else if id, ok := req.attrs.uint32(linux.NFTA_RULE_POSITION_ID); ok {
+		if pos = c.indexOf(tx.ruleIDs[id]); pos < 0 {
+			return syserr.ErrNoFileOrDir
+		}
+	}
+
+	userdata, err := req.userdata(linux.NFTA_RULE_USERDATA)
+	if err != nil {
+		return err
+	}
+	r := &rule{userdata: userdata}
+	if v, ok := req.attrs[linux.NFTA_RULE_EXPRESSIONS]; ok {
+		if r.exprs, err = parseExprs(&exprContext{tx: tx, table: t}, v); err != nil {
+			return err
+		}
+	}
+	// Jumps mustn't loop back to the chain.
+	var loopErr *syserr.Error
+	t.jumps(r, func(name string) {
+		if loopErr != nil {
+			return
+		}
+		target := t.chain(name)
+		if target == c {
+			loopErr = syserr.ErrLinkLoop
+			return
+		}
+		reachable, err := t.reachable(target)
+		if err != nil {
+			loopErr = err
+			return
+		}
+		for _, rc := range reachable {
+			if rc == c {
+				loopErr = syserr.ErrLinkLoop
+				return
+			}
+		}
+	})
+	if loopErr != nil {
+		return loopErr
+	}
+
+	r.handle = t.nextHandle()
+	switch {
+	case replace >= 0:
+		old := c.rules[replace]
+		c.rules[replace] = r
+		t.releaseRule(old)
+	case pos >= 0:
+		if req.flags&linux.NLM_F_APPEND != 0 {
+			pos++
+		}
+		c.rules = append(c.rules[:pos], append([]*rule{r}, c.rules[pos:]...)...)
+	case req.flags&linux.NLM_F_APPEND != 0:
+		c.rules = append(c.rules, r)
+	default:
+		c.rules = append([]*rule{r}, c.rules...)
+	}
+	if id, ok := req.attrs.uint32(linux.NFTA_RULE_ID); ok {
+		tx.ruleIDs[id] = r
+	}
+	return nil
+}
+
+// delRule handles NFT_MSG_DELRULE. Without a rule handle, it deletes all
+// rules of the chain, or all rules of the table without a chain.
+func (tx *transaction) delRule(req *request) *syserr.Error {
+	t, err := tx.lookupTable(req, linux.NFTA_RULE_TABLE, 0)
+	if err != nil {
+		return err
+	}
+	flush := func(c *chain) {
+		rules := c.rules
+		c.rules = nil
+		for _, r := range rules {
+			t.releaseRule(r)
+		}
+	}
+	if !req.attrs.has(linux.NFTA_RULE_CHAIN) {
+		for _, c := range t.chains {
+			flush(c)
+		}
+		return nil
+	}
+	c, err := tx.lookupChain(req, t, linux.NFTA_RULE_CHAIN, 0)
+	if err != nil {
+		return err
+	}
+	i := -1
+	if h, ok := req.attrs.uint64(linux.NFTA_RULE_HANDLE); ok {
+		i = c.index(h)
+	} else if id, ok := req.attrs.uint32(linux.NFTA_RULE_ID); ok {
+		i = c.indexOf(tx.ruleIDs[id])
+	} else {
+		flush(c)
+		return nil
+	}
+	if i < 0 {
+		return syserr.ErrNoFileOrDir
+	}
+	r := c.rules[i]
+	c.rules = append(c.rules[:i], c.rules[i+1:]...)
+	t.releaseRule(r)
+	return nil
+}
+
+// newSet handles NFT_MSG_NEWSET.
+func (tx *transaction) newSet(req *request) *syserr.Error {
+	t, err := tx.lookupTable(req, linux.NFTA_SET_TABLE, 0)
+	if err != nil {
+		return err
+	}
+	name, ok := req.attrs.string(linux.NFTA_SET_NAME)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	if len(name) >= linux.NFT_SET_MAXNAMELEN {
+		return syserr.ErrNameTooLong
+	}
+	s := &set{name: name}
+	s.flags, _ = req.attrs.uint32(linux.NFTA_SET_FLAGS)
+	if s.flags&unsupportedSetFlags != 0 {
+		return syserr.ErrNotSupported
+	}
+	switch {
+	case req.attrs.has(linux.NFTA_SET_TIMEOUT), req.attrs.has(linux.NFTA_SET_GC_INTERVAL), req.attrs.has(linux.NFTA_SET_EXPR), req.attrs.has(linux.NFTA_SET_EXPRESSIONS), req.attrs.has(linux.NFTA_SET_OBJ_TYPE):
+		return syserr.ErrNotSupported
+	}
+	s.keyType, _ = req.attrs.uint32(linux.NFTA_SET_KEY_TYPE)
+	keyLen, ok := req.attrs.uint32(linux.NFTA_SET_KEY_LEN)
+	if !ok || keyLen == 0 || keyLen > linux.NFT_DATA_VALUE_MAXLEN {
+		return syserr.ErrInvalidArgument
+	}
+	s.keyLen = int(keyLen)
+	if s.isMap() {
+		if s.dataType, ok = req.attrs.uint32(linux.NFTA_SET_DATA_TYPE); !ok {
+			return syserr.ErrInvalidArgument
+		}
+		if s.dataType != linux.NFT_DATA_VERDICT {
+			dataLen, ok := req.attrs.uint32(linux.NFTA_SET_DATA_LEN)
+			if !ok || dataLen == 0 || dataLen > linux.NFT_DATA_VALUE_MAXLEN {
+				return syserr.ErrInvalidArgument
+			}
+			s.dataLen = int(dataLen)
+		}
+	} else if req.attrs.has(linux.NFTA_SET_DATA_TYPE) {
+		return syserr.ErrInvalidArgument
+	}
+	s.policy, s.hasPolicy = req.attrs.uint32(linux.NFTA_SET_POLICY)
+	if v, ok := req.attrs[linux.NFTA_SET_DESC]; ok {
+		s.desc = append([]byte(nil), v...)
+	}
+	if s.userdata, err = req.userdata(linux.NFTA_SET_USERDATA); err != nil {
+		return err
+	}
+
+	if strings.Contains(name, "%d") {
+		// Allocate a name, as for anonymous sets.
+		for i := 0; ; i++ {
+			if n := strings.Replace(name, "%d", strconv.Itoa(i), 1); t.set(n) == nil {
+				s.name = n
+				break
+			}
+		}
+	} else if t.set(name) != nil {
+		if req.flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		return nil
+	}
+	s.handle = t.nextHandle()
+	t.sets = append(t.sets, s)
+	if id, ok := req.attrs.uint32(linux.NFTA_SET_ID); ok {
+		tx.setIDs[id] = s
+	}
+	return nil
+}
+
+// lookupSet returns the set of the request in t, as identified by its name
+// attribute typ, its handle attribute handleTyp if it's not 0, or its ID
+// attribute idTyp.
+func (tx *transaction) lookupSet(req *request, t *table, typ, handleTyp, idTyp uint16) (*set, *syserr.Error) {
+	var s *set
+	if name, ok := req.attrs.string(typ); ok {
+		s = t.set(name)
+	} else if h, ok := req.attrs.uint64(handleTyp); ok && handleTyp != 0 {
+		s = t.setByHandle(h)
+	} else if id, ok := req.attrs.uint32(idTyp); ok {
+		if s = tx.setIDs[id]; s != nil && t.set(s.name) != s {
+			s = nil
+		}
+	} else {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if s == nil {
+		return nil, syserr.ErrNoFileOrDir
+	}
+	return s, nil
+}
+
+// delSet handles NFT_MSG_DELSET.
+func (tx *transaction) delSet(req *request) *syserr.Error {
+	t, err := tx.lookupTable(req, linux.NFTA_SET_TABLE, 0)
+	if err != nil {
+		return err
+	}
+	s, err := tx.lookupSet(req, t, linux.NFTA_SET_NAME, linux.NFTA_SET_HANDLE, linux.NFTA_SET_ID)
+	if err != nil {
+		return err
+	}
+	if t.setUse(s.name) != 0 {
+		return syserr.ErrBusy
+	}
+	t.removeSet(s)
+	return nil
+}
+
+// newSetElem handles NFT_MSG_NEWSETELEM.
+func (tx *transaction) newSetElem(req *request) *syserr.Error {
+	t, err := tx.lookupTable(req, linux.NFTA_SET_ELEM_LIST_TABLE, 0)
+	if err != nil {
+		return err
+	}
+	s, err := tx.lookupSet(req, t, linux.NFTA_SET_ELEM_LIST_SET, 0, linux.NFTA_SET_ELEM_LIST_SET_ID)
+	if err != nil {
+		return err
+	}
+	list, err := parseAttrList(req.attrs[linux.NFTA_SET_ELEM_LIST_ELEMENTS])
+	if err != nil {
+		return err
+	}
+	ec := &exprContext{tx: tx, table: t}
+	for _, at := range list {
+		if at.typ != linux.NFTA_LIST_ELEM {
+			return syserr.ErrInvalidArgument
+		}
+		el, err := parseSetElem(ec, s, at.value)
+		if err != nil {
+			return err
+		}
+		if i := s.elem(el.key, el.flags); i >= 0 {
+			if req.flags&linux.NLM_F_EXCL != 0 {
+				return syserr.ErrExists
+			}
+			continue
+		}
+		s.elems = append(s.elems, el)
+	}
+	return nil
+}
+
+// delSetElem handles NFT_MSG_DELSETELEM. Without elements, it deletes all
+// elements of the set.
+func (tx *transaction) delSetElem(req *request) *syserr.Error {
+	t, err := tx.lookupTable(req, linux.NFTA_SET_ELEM_LIST_TABLE, 0)
+	if err != nil {
+		return err
+	}
+	s, err := tx.lookupSet(req, t, linux.NFTA_SET_ELEM_LIST_SET, 0, linux.NFTA_SET_ELEM_LIST_SET_ID)
+	if err != nil {
+		return err
+	}
+	if !req.attrs.has(linux.NFTA_SET_ELEM_LIST_ELEMENTS) {
+		s.elems = nil
+		return nil
+	}
+	list, err := parseAttrList(req.attrs[linux.NFTA_SET_ELEM_LIST_ELEMENTS])
+	if err != nil {
+		return err
+	}
+	for _, at := range list {
+		if at.typ != linux.NFTA_LIST_ELEM {
+			return syserr.ErrInvalidArgument
+		}
+		a, err := parseAttrs(at.value)
+		if err != nil {
+			return err
+		}
+		if !a.has(linux.NFTA_SET_ELEM_KEY) {
+			return syserr.ErrInvalidArgument
+		}
+		key, err := parseValue(a[linux.NFTA_SET_ELEM_KEY])
+		if err != nil {
+			return err
+		}
+		flags, _ := a.uint32(linux.NFTA_SET_ELEM_FLAGS)
+		i := s.elem(key, flags)
+		if i < 0 {
+			return syserr.ErrNoFileOrDir
+		}
+		s.elems = append(s.elems[:i], s.elems[i+1:]...)
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ package route
 
 import (
 	"bytes"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -202,13 +203,97 @@ func (p *Protocol) delLink(ctx context.Context, msg *netlink.Message, ms *netlin
 	return syserr.FromError(stack.RemoveInterface(ifinfomsg.Index))
 }
 
+// newLink handles RTM_NEWLINK requests. Only changes to the administrative
+// state (IFF_UP) of existing interfaces are supported.
+func (p *Protocol) newLink(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+
+	var ifinfomsg linux.InterfaceInfoMessage
+	attrs, ok := msg.GetData(&ifinfomsg)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	var (
+		byName []byte
+		mtu    *uint32
+	)
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		switch ahdr.Type {
+		case linux.IFLA_IFNAME:
+			if len(value) < 1 {
+				return syserr.ErrInvalidArgument
+			}
+			byName = value[:len(value)-1]
+		case linux.IFLA_MTU:
+			var v primitive.Uint32
+			if len(value) < v.SizeBytes() {
+				return syserr.ErrInvalidArgument
+			}
+			v.UnmarshalUnsafe(value)
+			m := uint32(v)
+			mtu = &m
+		default:
+			return syserr.ErrNotSupported
+		}
+	}
+
+	var (
+		iface inet.Interface
+		found bool
+	)
+	for idx, i := range stack.Interfaces() {
+		if (ifinfomsg.Index > 0 && idx == ifinfomsg.Index) || (ifinfomsg.Index == 0 && byName != nil && string(byName) == i.Name) {
+			ifinfomsg.Index = idx
+			iface = i
+			found = true
+			break
+		}
+	}
+	if !found {
+		hdr := msg.Header()
+		if hdr.Flags&linux.NLM_F_CREATE == linux.NLM_F_CREATE {
+			// Creating interfaces isn't supported.
+			return syserr.ErrNotSupported
+		}
+		return syserr.ErrNoDevice
+	}
+	if mtu != nil && *mtu != iface.MTU {
+		return syserr.ErrNotSupported
+	}
+
+	// See net/core/dev.c:rtnl_dev_combine_flags().
+	flags := ifinfomsg.Flags
+	if ifinfomsg.Change != 0 {
+		flags = (flags & ifinfomsg.Change) | (iface.Flags &^ ifinfomsg.Change)
+	}
+	if (flags^iface.Flags)&linux.IFF_UP == 0 {
+		return nil
+	}
+	return syserr.FromError(stack.SetInterfaceUp(ifinfomsg.Index, flags&linux.IFF_UP != 0))
+}
+
 // addNewLinkMessage appends RTM_NEWLINK message for the given interface into
 // the message set.
 func addNewLinkMessage(ms *netlink.MessageSet, idx int32, i inet.Interface) {
 	m := ms.AddMessage(linux.NetlinkMessageHeader{
 		Type: linux.RTM_NEWLINK,
 	})
+	putLink(m, idx, i)
+}
 
+// putLink fills m with the InterfaceInfoMessage and attributes describing the
+// given interface.
+func putLink(m *netlink.Message, idx int32, i inet.Interface) {
 	m.Put(&linux.InterfaceInfoMessage{
 		Family: linux.AF_UNSPEC,
 		Type:   i.DeviceType,
@@ -257,22 +342,103 @@ func (p *Protocol) dumpAddrs(ctx context.Context, msg *netlink.Message, ms *netl
 			m := ms.AddMessage(linux.NetlinkMessageHeader{
 				Type: linux.RTM_NEWADDR,
 			})
+			putAddr(m, id, a)
+		}
+	}
 
-			m.Put(&linux.InterfaceAddrMessage{
-				Family:    a.Family,
-				PrefixLen: a.PrefixLen,
-				Index:     uint32(id),
-			})
+	return nil
+}
 
-			addr := primitive.ByteSlice([]byte(a.Addr))
-			m.PutAttr(linux.IFA_LOCAL, &addr)
-			m.PutAttr(linux.IFA_ADDRESS, &addr)
+// putAddr adds an InterfaceAddrMessage describing a and its attributes to m.
+func putAddr(m *netlink.Message, idx int32, a inet.InterfaceAddr) {
+	m.Put(&linux.InterfaceAddrMessage{
+		Family:    a.Family,
+		PrefixLen: a.PrefixLen,
+		Flags:     a.Flags,
+		Index:     uint32(idx),
+	})
 
-			// TODO(gvisor.dev/issue/578): There are many more attributes.
-		}
+	addr := primitive.ByteSlice([]byte(a.Addr))
+	m.PutAttr(linux.IFA_LOCAL, &addr)
+	m.PutAttr(linux.IFA_ADDRESS, &addr)
+	m.PutAttr(linux.IFA_FLAGS, primitive.AllocateUint32(uint32(a.Flags)))
+
+	ci := linux.InterfaceAddrCacheInfo{
+		Preferred: lifetimeToSeconds(a.PreferredLifetime),
+		Valid:     lifetimeToSeconds(a.ValidLifetime),
+	}
+	if a.Flags&linux.IFA_F_DEPRECATED != 0 {
+		ci.Preferred = 0
 	}
+	m.PutAttr(linux.IFA_CACHEINFO, &ci)
 
-	return nil
+	// TODO(gvisor.dev/issue/578): There are many more attributes.
+}
+
+// lifetimeToSeconds converts an inet.InterfaceAddr lifetime to the number of
+// seconds used in struct ifa_cacheinfo.
+func lifetimeToSeconds(d time.Duration) uint32 {
+	if d == 0 {
+		return linux.INFINITY_LIFE_TIME
+	}
+	if secs := d / time.Second; secs < linux.INFINITY_LIFE_TIME {
+		return uint32(secs)
+	}
+	return linux.INFINITY_LIFE_TIME - 1
+}
+
+// secondsToLifetime is the inverse of lifetimeToSeconds.
+func secondsToLifetime(secs uint32) time.Duration {
+	if secs == linux.INFINITY_LIFE_TIME {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// notifyAddrRemoved sends an RTM_DELADDR message for addr to the NETLINK_ROUTE
+// sockets in stack's network namespace that are listening for address changes.
+func notifyAddrRemoved(stack inet.Stack, idx int32, addr inet.InterfaceAddr) {
+	notifyAddr(stack, linux.RTM_DELADDR, idx, addr)
+}
+
+// notifyAddrAdded sends an RTM_NEWADDR message for addr to the NETLINK_ROUTE
+// sockets in stack's network namespace that are listening for address
+// changes.
+func notifyAddrAdded(stack inet.Stack, idx int32, addr inet.InterfaceAddr) {
+	notifyAddr(stack, linux.RTM_NEWADDR, idx, addr)
+}
+
+func notifyAddr(stack inet.Stack, typ uint16, idx int32, addr inet.InterfaceAddr) {
+	var group uint32
+	switch addr.Family {
+	case linux.AF_INET:
+		group = linux.RTNLGRP_IPV4_IFADDR
+	case linux.AF_INET6:
+		group = linux.RTNLGRP_IPV6_IFADDR
+	default:
+		return
+	}
+
+	m := netlink.NewMessage(linux.NetlinkMessageHeader{
+		Type: typ,
+	})
+	putAddr(m, idx, addr)
+	netlink.SendMulticast(context.Background(), stack, linux.NETLINK_ROUTE, group, m)
+}
+
+// notifyLinkChanged sends an RTM_NEWLINK or RTM_DELLINK message for the
+// interface iface to the NETLINK_ROUTE sockets in stack's network namespace
+// that are listening for link changes.
+func notifyLinkChanged(stack inet.Stack, idx int32, iface inet.Interface, removed bool) {
+	typ := uint16(linux.RTM_NEWLINK)
+	if removed {
+		typ = linux.RTM_DELLINK
+	}
+	m := netlink.NewMessage(linux.NetlinkMessageHeader{
+		Type: typ,
+	})
+	putLink(m, idx, iface)
+	netlink.SendMulticast(context.Background(), stack, linux.NETLINK_ROUTE, linux.RTNLGRP_LINK, m)
 }
 
 // commonPrefixLen reports the length of the longest IP address prefix.
@@ -438,6 +604,9 @@ func (p *Protocol) dumpRoutes(ctx context.Context, msg *netlink.Message, ms *net
 		if len(rt.GatewayAddr) > 0 {
 			m.PutAttr(linux.RTA_GATEWAY, primitive.AsByteSlice(rt.GatewayAddr))
 		}
+		if rt.Priority != 0 {
+			m.PutAttr(linux.RTA_PRIORITY, primitive.AllocateUint32(rt.Priority))
+		}
 
 		// TODO(gvisor.dev/issue/578): There are many more attributes.
 	}
@@ -445,6 +614,116 @@ func (p *Protocol) dumpRoutes(ctx context.Context, msg *netlink.Message, ms *net
 	return nil
 }
 
+// parseRoute parses an RTM_NEWROUTE or RTM_DELROUTE request.
+func parseRoute(msg *netlink.Message) (inet.Route, *syserr.Error) {
+	var rtMsg linux.RouteMessage
+	attrs, ok := msg.GetData(&rtMsg)
+	if !ok {
+		return inet.Route{}, syserr.ErrInvalidArgument
+	}
+	route := inet.Route{
+		Family:   rtMsg.Family,
+		DstLen:   rtMsg.DstLen,
+		SrcLen:   rtMsg.SrcLen,
+		TOS:      rtMsg.TOS,
+		Table:    rtMsg.Table,
+		Protocol: rtMsg.Protocol,
+		Scope:    rtMsg.Scope,
+		Type:     rtMsg.Type,
+		Flags:    rtMsg.Flags,
+	}
+	table := uint32(rtMsg.Table)
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return inet.Route{}, syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		switch ahdr.Type {
+		case linux.RTA_DST:
+			route.DstAddr = value
+		case linux.RTA_GATEWAY:
+			route.GatewayAddr = value
+		case linux.RTA_OIF:
+			var oif primitive.Int32
+			if len(value) < oif.SizeBytes() {
+				return inet.Route{}, syserr.ErrInvalidArgument
+			}
+			oif.UnmarshalUnsafe(value)
+			route.OutputInterface = int32(oif)
+		case linux.RTA_PRIORITY:
+			var priority primitive.Uint32
+			if len(value) < priority.SizeBytes() {
+				return inet.Route{}, syserr.ErrInvalidArgument
+			}
+			priority.UnmarshalUnsafe(value)
+			route.Priority = uint32(priority)
+		case linux.RTA_TABLE:
+			var t primitive.Uint32
+			if len(value) < t.SizeBytes() {
+				return inet.Route{}, syserr.ErrInvalidArgument
+			}
+			t.UnmarshalUnsafe(value)
+			table = uint32(t)
+		default:
+			// TODO(gvisor.dev/issue/578): There are many more attributes.
+			return inet.Route{}, syserr.ErrNotSupported
+		}
+	}
+
+	// We don't have multiple routing tables, so only the main table can be
+	// changed.
+	if table != linux.RT_TABLE_UNSPEC && table != linux.RT_TABLE_MAIN {
+		return inet.Route{}, syserr.ErrNotSupported
+	}
+	// Source-specific routes aren't supported either.
+	if route.SrcLen != 0 {
+		return inet.Route{}, syserr.ErrNotSupported
+	}
+	return route, nil
+}
+
+// newRoute handles RTM_NEWROUTE requests.
+func (p *Protocol) newRoute(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+
+	route, err := parseRoute(msg)
+	if err != nil {
+		return err
+	}
+	// Only unicast routes are supported.
+	if route.Type != linux.RTN_UNICAST {
+		return syserr.ErrNotSupported
+	}
+	if err := stack.AddRoute(route, msg.Header().Flags); err != nil {
+		return syserr.FromError(err)
+	}
+	return nil
+}
+
+// delRoute handles RTM_DELROUTE requests.
+func (p *Protocol) delRoute(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// No network stack.
+		return syserr.ErrProtocolNotSupported
+	}
+
+	route, err := parseRoute(msg)
+	if err != nil {
+		return err
+	}
+	if err := stack.RemoveRoute(route); err != nil {
+		return syserr.FromError(err)
+	}
+	return nil
+}
+
 // newAddr handles RTM_NEWADDR requests.
 func (p *Protocol) newAddr(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
 	stack := inet.StackFromContext(ctx)
@@ -459,6 +738,10 @@ func (p *Protocol) newAddr(ctx context.Context, msg *netlink.Message, ms *netlin
 		return syserr.ErrInvalidArgument
 	}
 
+	var (
+		locals    [][]byte
+		cacheInfo *linux.InterfaceAddrCacheInfo
+	)
 	for !attrs.Empty() {
 		ahdr, value, rest, ok := attrs.ParseFirst()
 		if !ok {
@@ -473,25 +756,51 @@ func (p *Protocol) newAddr(ctx context.Context, msg *netlink.Message, ms *netlin
 		// and ignore the IFA_ADDRESS.
 		switch ahdr.Type {
 		case linux.IFA_LOCAL:
-			err := stack.AddInterfaceAddr(int32(ifa.Index), inet.InterfaceAddr{
-				Family:    ifa.Family,
-				PrefixLen: ifa.PrefixLen,
-				Flags:     ifa.Flags,
-				Addr:      value,
-			})
-			if err == unix.EEXIST {
-				flags := msg.Header().Flags
-				if flags&linux.NLM_F_EXCL != 0 {
-					return syserr.ErrExists
-				}
-			} else if err != nil {
+			locals = append(locals, value)
+		case linux.IFA_CACHEINFO:
+			var ci linux.InterfaceAddrCacheInfo
+			if len(value) < ci.SizeBytes() {
 				return syserr.ErrInvalidArgument
 			}
+			ci.UnmarshalUnsafe(value)
+			cacheInfo = &ci
 		case linux.IFA_ADDRESS:
 		default:
 			return syserr.ErrNotSupported
 		}
 	}
+
+	// Deprecation is controlled by the preferred lifetime, not by flags.
+	addr := inet.InterfaceAddr{
+		Family:    ifa.Family,
+		PrefixLen: ifa.PrefixLen,
+		Flags:     ifa.Flags &^ linux.IFA_F_DEPRECATED,
+	}
+	if cacheInfo != nil {
+		// Like Linux, reject addresses that are already invalid or that
+		// would remain preferred after becoming invalid.
+		if cacheInfo.Valid == 0 || cacheInfo.Preferred > cacheInfo.Valid {
+			return syserr.ErrInvalidArgument
+		}
+		if cacheInfo.Preferred == 0 {
+			addr.Flags |= linux.IFA_F_DEPRECATED
+		}
+		addr.PreferredLifetime = secondsToLifetime(cacheInfo.Preferred)
+		addr.ValidLifetime = secondsToLifetime(cacheInfo.Valid)
+	}
+
+	for _, local := range locals {
+		addr.Addr = local
+		err := stack.AddInterfaceAddr(int32(ifa.Index), addr)
+		if err == unix.EEXIST {
+			flags := msg.Header().Flags
+			if flags&linux.NLM_F_EXCL != 0 {
+				return syserr.ErrExists
+			}
+		} else if err != nil {
+			return syserr.ErrInvalidArgument
+		}
+	}
 	return nil
 }
 
@@ -578,10 +887,16 @@ func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms
 		switch hdr.Type {
 		case linux.RTM_GETLINK:
 			return p.getLink(ctx, msg, ms)
+		case linux.RTM_NEWLINK:
+			return p.newLink(ctx, msg, ms)
 		case linux.RTM_DELLINK:
 			return p.delLink(ctx, msg, ms)
 		case linux.RTM_GETROUTE:
 			return p.dumpRoutes(ctx, msg, ms)
+		case linux.RTM_NEWROUTE:
+			return p.newRoute(ctx, msg, ms)
+		case linux.RTM_DELROUTE:
+			return p.delRoute(ctx, msg, ms)
 		case linux.RTM_NEWADDR:
 			return p.newAddr(ctx, msg, ms)
 		case linux.RTM_DELADDR:
@@ -596,4 +911,7 @@ func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms
 // init registers the NETLINK_ROUTE provider.
 func init() {
 	netlink.RegisterProvider(linux.NETLINK_ROUTE, NewProtocol)
+	inet.RegisterInterfaceAddrAddedHandler(notifyAddrAdded)
+	inet.RegisterInterfaceAddrRemovedHandler(notifyAddrRemoved)
+	inet.RegisterInterfaceChangedHandler(notifyLinkChanged)
 }
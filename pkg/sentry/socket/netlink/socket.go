@@ -21,6 +21,7 @@ import (
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/abi/linux/errno"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
@@ -30,6 +31,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/device"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
@@ -108,6 +110,18 @@ type socketOpsCommon struct {
 	// sent to userspace.
 	connection transport.ConnectedEndpoint
 
+	// netns is the network namespace that the socket was created in.
+	// Multicast messages are only delivered to sockets in the network
+	// namespace they originate from.
+	//
+	// netns is immutable.
+	netns *inet.Namespace
+
+	// groups is the bitmask of multicast groups that this socket is a
+	// member of, where bit N-1 represents group N. groups is only modified
+	// with mu held.
+	groups atomicbitops.Uint32
+
 	// mu protects the fields below.
 	mu sync.Mutex `state:"nosave"`
 
@@ -157,6 +171,7 @@ func NewSocket(t *kernel.Task, skType linux.SockType, protocol Protocol) (*Socke
 			skType:         skType,
 			ep:             ep,
 			connection:     connection,
+			netns:          t.NetworkNamespace(),
 			sendBufferSize: defaultSendBufferSize,
 		},
 	}, nil
@@ -164,6 +179,12 @@ func NewSocket(t *kernel.Task, skType linux.SockType, protocol Protocol) (*Socke
 
 // Release implements fs.FileOperations.Release.
 func (s *socketOpsCommon) Release(ctx context.Context) {
+	// Stop receiving multicast messages before the connection is released.
+	if s.groups.Load() != 0 {
+		s.mu.Lock()
+		s.setGroupsLocked(0)
+		s.mu.Unlock()
+	}
 	s.connection.Release(ctx)
 	s.ep.Close(ctx)
 
@@ -267,15 +288,19 @@ func (s *socketOpsCommon) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 		return err
 	}
 
-	// No support for multicast groups yet.
-	if a.Groups != 0 {
-		return syserr.ErrPermissionDenied
-	}
-
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.bindPort(t, int32(a.PortID))
+	if err := s.bindPort(t, int32(a.PortID)); err != nil {
+		return err
+	}
+
+	// Like Linux, bind(2) replaces the set of multicast groups that the
+	// socket is a member of.
+	if a.Groups != 0 || s.groups.Load() != 0 {
+		s.setGroupsLocked(a.Groups)
+	}
+	return nil
 }
 
 // Connect implements socket.Socket.Connect.
@@ -285,7 +310,7 @@ func (s *socketOpsCommon) Connect(t *kernel.Task, sockaddr []byte, blocking bool
 		return err
 	}
 
-	// No support for multicast groups yet.
+	// Sending to multicast groups isn't supported.
 	if a.Groups != 0 {
 		return syserr.ErrPermissionDenied
 	}
@@ -356,6 +381,16 @@ func (s *socketOpsCommon) GetSockOpt(t *kernel.Task, level int, name int, outPtr
 				passcred = 1
 			}
 			return &passcred, nil
+
+		case linux.SO_PEEK_OFF:
+			if outLen < sizeOfInt32 {
+				return nil, syserr.ErrInvalidArgument
+			}
+			v, err := s.ep.GetSockOptInt(tcpip.PeekOffsetOption)
+			if err != nil {
+				return nil, syserr.TranslateNetstackError(err)
+			}
+			return primitive.AllocateInt32(int32(v)), nil
 		}
 	case linux.SOL_NETLINK:
 		switch name {
@@ -410,6 +445,15 @@ func (s *socketOpsCommon) SetSockOpt(t *kernel.Task, level int, name int, opt []
 			s.ep.SocketOptions().SetPassCred(passcred != 0)
 			return nil
 
+		case linux.SO_PEEK_OFF:
+			// Messages are queued on a unix transport endpoint, which
+			// implements peeking at an offset.
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+			v := int32(hostarch.ByteOrder.Uint32(opt))
+			return syserr.TranslateNetstackError(s.ep.SetSockOptInt(tcpip.PeekOffsetOption, int(v)))
+
 		case linux.SO_ATTACH_FILTER:
 			// TODO(gvisor.dev/issue/1119): We don't actually
 			// support filtering. If this socket can't ever send
@@ -444,10 +488,34 @@ func (s *socketOpsCommon) SetSockOpt(t *kernel.Task, level int, name int, opt []
 		}
 	case linux.SOL_NETLINK:
 		switch name {
-		case linux.NETLINK_ADD_MEMBERSHIP,
-			linux.NETLINK_BROADCAST_ERROR,
+		case linux.NETLINK_ADD_MEMBERSHIP, linux.NETLINK_DROP_MEMBERSHIP:
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+			group := hostarch.ByteOrder.Uint32(opt)
+			if group == 0 || group > maxGroups {
+				return syserr.ErrInvalidArgument
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			groups := s.groups.Load()
+			if name == linux.NETLINK_ADD_MEMBERSHIP {
+				// Joining a group binds the socket, like Linux.
+				if !s.bound {
+					if err := s.bindPort(t, 0); err != nil {
+						return err
+					}
+				}
+				groups |= 1 << (group - 1)
+			} else {
+				groups &^= 1 << (group - 1)
+			}
+			s.setGroupsLocked(groups)
+			return nil
+
+		case linux.NETLINK_BROADCAST_ERROR,
 			linux.NETLINK_CAP_ACK,
-			linux.NETLINK_DROP_MEMBERSHIP,
 			linux.NETLINK_DUMP_STRICT_CHK,
 			linux.NETLINK_EXT_ACK,
 			linux.NETLINK_LISTEN_ALL_NSID,
@@ -469,6 +537,7 @@ func (s *socketOpsCommon) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *
 	sa := &linux.SockAddrNetlink{
 		Family: linux.AF_NETLINK,
 		PortID: uint32(s.portID),
+		Groups: s.groups.Load(),
 	}
 	return sa, uint32(sa.SizeBytes()), nil
 }
@@ -705,7 +774,7 @@ func (s *socketOpsCommon) sendMsg(ctx context.Context, src usermem.IOSequence, t
 			return 0, err
 		}
 
-		// No support for multicast groups yet.
+		// Sending to multicast groups isn't supported.
 		if a.Groups != 0 {
 			return 0, syserr.ErrPermissionDenied
 		}
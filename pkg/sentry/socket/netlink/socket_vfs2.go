@@ -76,6 +76,7 @@ func NewVFS2(t *kernel.Task, skType linux.SockType, protocol Protocol) (*SocketV
 			skType:         skType,
 			ep:             ep,
 			connection:     connection,
+			netns:          t.NetworkNamespace(),
 			sendBufferSize: defaultSendBufferSize,
 		},
 	}
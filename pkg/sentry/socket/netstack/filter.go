@@ -0,0 +1,140 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// socketFilter is a classic BPF program attached to a socket with
+// SO_ATTACH_FILTER.
+//
+// +stateify savable
+type socketFilter struct {
+	program bpf.Program
+}
+
+var _ tcpip.SocketFilter = (*socketFilter)(nil)
+
+// Filter implements tcpip.SocketFilter.Filter.
+func (f *socketFilter) Filter(data []byte, info tcpip.SocketFilterInfo) uint32 {
+	n, err := bpf.Exec(f.program, socketFilterInput{
+		InputBytes: bpf.InputBytes{Data: data, Order: binary.BigEndian},
+		info:       info,
+	})
+	if err != nil {
+		// Like Linux, drop the packet if the program performs an invalid
+		// load.
+		return 0
+	}
+	return n
+}
+
+// copyInSocketFilter copies in the struct sock_fprog in optVal and the
+// program it points to, and compiles the program.
+func copyInSocketFilter(t *kernel.Task, optVal []byte) (*socketFilter, *syserr.Error) {
+	if len(optVal) < linux.SizeOfSockFprog {
+		return nil, syserr.ErrInvalidArgument
+	}
+	length := hostarch.ByteOrder.Uint16(optVal)
+	addr := hostarch.Addr(hostarch.ByteOrder.Uint64(optVal[8:]))
+	if length == 0 || length > bpf.MaxInstructions || addr == 0 {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	insns := make([]linux.BPFInstruction, length)
+	if _, err := linux.CopyBPFInstructionSliceIn(t, addr, insns); err != nil {
+		return nil, syserr.FromError(err)
+	}
+	for _, insn := range insns {
+		switch insn.OpCode {
+		case bpf.Ld | bpf.Abs | bpf.W, bpf.Ld | bpf.Abs | bpf.H, bpf.Ld | bpf.Abs | bpf.B:
+			// Only the ancillary loads that socketFilterInput implements
+			// are accepted; Linux's other negative offsets aren't
+			// supported.
+			if int32(insn.K) >= 0 {
+				continue
+			}
+			switch insn.K {
+			case linux.SKF_AD_OFF + linux.SKF_AD_PROTOCOL,
+				linux.SKF_AD_OFF + linux.SKF_AD_PKTTYPE,
+				linux.SKF_AD_OFF + linux.SKF_AD_IFINDEX:
+			default:
+				t.Debugf("Unsupported socket filter load offset %#x", insn.K)
+				return nil, syserr.ErrInvalidArgument
+			}
+		}
+	}
+	program, err := bpf.Compile(insns)
+	if err != nil {
+		t.Debugf("Invalid socket filter: %v", err)
+		return nil, syserr.ErrInvalidArgument
+	}
+	return &socketFilter{program: program}, nil
+}
+
+// socketFilterInput implements bpf.Input for socket filters. Loads at
+// offsets at or above linux.SKF_AD_OFF access the packet's metadata.
+type socketFilterInput struct {
+	bpf.InputBytes
+	info tcpip.SocketFilterInfo
+}
+
+// ancillary returns the packet metadata at off.
+func (i socketFilterInput) ancillary(off uint32) (uint32, bool) {
+	switch off - linux.SKF_AD_OFF {
+	case linux.SKF_AD_PROTOCOL:
+		return uint32(i.info.Protocol), true
+	case linux.SKF_AD_PKTTYPE:
+		return uint32(toLinuxPacketType(i.info.PktType)), true
+	case linux.SKF_AD_IFINDEX:
+		return uint32(i.info.NIC), true
+	default:
+		return 0, false
+	}
+}
+
+// Load32 implements bpf.Input.Load32.
+func (i socketFilterInput) Load32(off uint32) (uint32, bool) {
+	if off >= linux.SKF_AD_OFF {
+		return i.ancillary(off)
+	}
+	return i.InputBytes.Load32(off)
+}
+
+// Load16 implements bpf.Input.Load16.
+func (i socketFilterInput) Load16(off uint32) (uint16, bool) {
+	if off >= linux.SKF_AD_OFF {
+		v, ok := i.ancillary(off)
+		return uint16(v), ok
+	}
+	return i.InputBytes.Load16(off)
+}
+
+// Load8 implements bpf.Input.Load8.
+func (i socketFilterInput) Load8(off uint32) (uint8, bool) {
+	if off >= linux.SKF_AD_OFF {
+		v, ok := i.ancillary(off)
+		return uint8(v), ok
+	}
+	return i.InputBytes.Load8(off)
+}
@@ -51,6 +51,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/socket"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netfilter"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -59,6 +60,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/tcpip/transport"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/sctp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.dev/gvisor/pkg/usermem"
 	"gvisor.dev/gvisor/pkg/waiter"
@@ -259,6 +261,12 @@ var Metrics = tcpip.Stats{
 		ListenOverflowSynCookieSent:        mustCreateMetric("/netstack/tcp/listen_overflow_syn_cookie_sent", "Number of times a SYN cookie was sent."),
 		ListenOverflowSynCookieRcvd:        mustCreateMetric("/netstack/tcp/listen_overflow_syn_cookie_rcvd", "Number of times a SYN cookie was received."),
 		ListenOverflowInvalidSynCookieRcvd: mustCreateMetric("/netstack/tcp/listen_overflow_invalid_syn_cookie_rcvd", "Number of times an invalid SYN cookie was received."),
+		FastOpenActive:                     mustCreateMetric("/netstack/tcp/fast_open_active", "Number of active opens that sent data in the SYN with a TCP Fast Open cookie."),
+		FastOpenActiveFail:                 mustCreateMetric("/netstack/tcp/fast_open_active_fail", "Number of active opens whose SYN data was not acknowledged by the peer."),
+		FastOpenPassive:                    mustCreateMetric("/netstack/tcp/fast_open_passive", "Number of passive opens whose SYN data was accepted by a valid TCP Fast Open cookie."),
+		FastOpenPassiveFail:                mustCreateMetric("/netstack/tcp/fast_open_passive_fail", "Number of SYNs received with an invalid TCP Fast Open cookie."),
+		FastOpenListenOverflow:             mustCreateMetric("/netstack/tcp/fast_open_listen_overflow", "Number of SYNs with a valid TCP Fast Open cookie whose data was not accepted because the TCP Fast Open queue was full."),
+		FastOpenCookieReqd:                 mustCreateMetric("/netstack/tcp/fast_open_cookie_reqd", "Number of TCP Fast Open cookie requests received."),
 		FailedConnectionAttempts:           mustCreateMetric("/netstack/tcp/failed_connection_attempts", "Number of calls to Connect or Listen (active and passive openings, respectively) that end in an error."),
 		ValidSegmentsReceived:              mustCreateMetric("/netstack/tcp/valid_segments_received", "Number of TCP segments received that the transport layer successfully parsed."),
 		InvalidSegmentsReceived:            mustCreateMetric("/netstack/tcp/invalid_segments_received", "Number of TCP segments received that the transport layer could not parse."),
@@ -296,6 +304,8 @@ const DefaultTTL = 64
 
 const sizeOfInt32 int = 4
 
+const sizeOfInt64 int = 8
+
 var errStackType = syserr.New("expected but did not receive a netstack.Stack", errno.EINVAL)
 
 // commonEndpoint represents the intersection of a tcpip.Endpoint and a
@@ -389,6 +399,17 @@ type socketOpsCommon struct {
 	// TODO(b/153685824): Move this to SocketOptions.
 	// sockOptInq corresponds to TCP_INQ.
 	sockOptInq bool
+
+	// packetMu protects the below fields, which hold the SOL_PACKET state of
+	// packet sockets.
+	packetMu sync.Mutex `state:"nosave"`
+	// packetVersion corresponds to PACKET_VERSION.
+	packetVersion int32
+	// rxRing is the ring configured with PACKET_RX_RING, if any.
+	rxRing *packetRing
+	// packetStats holds the state of PACKET_STATISTICS for sockets without
+	// a ring.
+	packetStats packetStats
 }
 
 // New creates a new endpoint socket.
@@ -447,6 +468,12 @@ func (s *socketOpsCommon) Release(ctx context.Context) {
 
 	s.Endpoint.Close()
 
+	s.packetMu.Lock()
+	if err := s.releaseRxRingLocked(); err != nil {
+		log.Warningf("Failed to release packet ring: %v", err)
+	}
+	s.packetMu.Unlock()
+
 	// SO_LINGER option is valid only for TCP. For other socket types
 	// return after endpoint close.
 	if family, skType, _ := s.Type(); skType != linux.SOCK_STREAM || (family != linux.AF_INET && family != linux.AF_INET6) {
@@ -865,9 +892,22 @@ func GetSockOpt(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, family in
 	case linux.SOL_ICMPV6:
 		return getSockOptICMPv6(t, s, ep, name, outLen)
 
-	case linux.SOL_UDP,
-		linux.SOL_RAW,
-		linux.SOL_PACKET:
+	case linux.SOL_PACKET:
+		if ps, ok := s.(packetSockOpts); ok && family == linux.AF_PACKET {
+			return ps.getSockOptPacket(t, name, outPtr, outLen)
+		}
+
+	case linux.SOL_UDP:
+		if _, skType, skProto := s.Type(); isUDPSocket(skType, skProto) {
+			return getSockOptUDP(t, s, ep, name, outLen)
+		}
+
+	case linux.SOL_SCTP:
+		if _, skType, skProto := s.Type(); isSCTPSocket(skType, skProto) {
+			return getSockOptSCTP(t, s, ep, family, name, outLen)
+		}
+
+	case linux.SOL_RAW:
 		// Not supported.
 	}
 
@@ -1052,6 +1092,26 @@ func getSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, fam
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetNoChecksum()))
 		return &v, nil
 
+	case linux.SO_ZEROCOPY:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetZeroCopy()))
+		return &v, nil
+
+	case linux.SO_TIMESTAMPING:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		flags := int32(ep.SocketOptions().GetTimestamping())
+		if outLen >= linux.SizeOfSoTimestamping {
+			return &linux.SoTimestamping{Flags: flags}, nil
+		}
+		v := primitive.Int32(flags)
+		return &v, nil
+
 	case linux.SO_ACCEPTCONN:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1065,6 +1125,14 @@ func getSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, fam
 		vP := primitive.Int32(boolToInt32(v))
 		return &vP, nil
 
+	case linux.SO_LOCK_FILTER:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetFilterLocked()))
+		return &v, nil
+
 	case linux.SO_RCVLOWAT:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1072,6 +1140,65 @@ func getSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, fam
 
 		v := primitive.Int32(ep.SocketOptions().GetRcvlowat())
 		return &v, nil
+
+	case linux.SO_PEEK_OFF:
+		// Like Linux, only unix sockets support peeking at an offset.
+		if family != linux.AF_UNIX {
+			return nil, syserr.ErrNotSupported
+		}
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.PeekOffsetOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
+
+	case linux.SO_BUSY_POLL:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(ep.SocketOptions().GetBusyPoll())
+		return &v, nil
+
+	case linux.SO_INCOMING_CPU:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(ep.SocketOptions().GetIncomingCPU())
+		return &v, nil
+
+	case linux.SO_INCOMING_NAPI_ID:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		// Like Linux for packets that weren't received through NAPI, report
+		// no NAPI ID, since netstack receives packets without NAPI.
+		v := primitive.Int32(0)
+		return &v, nil
+
+	case linux.SO_MAX_PACING_RATE:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		rate := ep.SocketOptions().GetMaxPacingRate()
+		if outLen >= sizeOfInt64 {
+			v := primitive.Uint64(rate)
+			return &v, nil
+		}
+		// Like Linux, report rates that don't fit in 32 bits as ~0U.
+		if rate > math.MaxUint32 {
+			rate = math.MaxUint32
+		}
+		v := primitive.Uint32(rate)
+		return &v, nil
 	}
 	return nil, syserr.ErrProtocolNotAvailable
 }
@@ -1174,15 +1301,41 @@ func getSockOptTCP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name,
 			return nil, syserr.TranslateNetstackError(err)
 		}
 
-		// TODO(b/64800844): Translate fields once they are added to
-		// tcpip.TCPInfoOption.
+		// Fields that netstack doesn't track are left as zero.
 		info := linux.TCPInfo{
-			State:       uint8(v.State),
-			RTO:         uint32(v.RTO / time.Microsecond),
-			RTT:         uint32(v.RTT / time.Microsecond),
-			RTTVar:      uint32(v.RTTVar / time.Microsecond),
-			SndSsthresh: v.SndSsthresh,
-			SndCwnd:     v.SndCwnd,
+			State:         uint8(v.State),
+			Retransmits:   uint8(v.Retransmits),
+			WindowScale:   v.SndWndScale&0xf | v.RcvWndScale<<4,
+			RTO:           uint32(v.RTO / time.Microsecond),
+			SndMss:        v.SndMSS,
+			Unacked:       v.Unacked,
+			Sacked:        v.Sacked,
+			RTT:           uint32(v.RTT / time.Microsecond),
+			RTTVar:        uint32(v.RTTVar / time.Microsecond),
+			SndSsthresh:   v.SndSsthresh,
+			SndCwnd:       v.SndCwnd,
+			Advmss:        v.AdvMSS,
+			TotalRetrans:  v.TotalRetransmits,
+			PacingRate:    v.PacingRate,
+			BytesAcked:    v.BytesAcked,
+			BytesReceived: v.BytesReceived,
+			SegsOut:       uint32(v.SegmentsSent),
+			SegsIn:        uint32(v.SegmentsReceived),
+			NotSentBytes:  v.NotSentBytes,
+			MinRTT:        uint32(v.MinRTT / time.Microsecond),
+			DeliveryRate:  v.DeliveryRate,
+			BytesSent:     v.BytesSent,
+			BytesRetrans:  v.BytesRetransmitted,
+		}
+		info.MaxPacingRate = ep.SocketOptions().GetMaxPacingRate()
+		if v.Timestamps {
+			info.Options |= linux.TCPI_OPT_TIMESTAMPS
+		}
+		if v.SACKPermitted {
+			info.Options |= linux.TCPI_OPT_SACK
+		}
+		if v.SndWndScale != 0 || v.RcvWndScale != 0 {
+			info.Options |= linux.TCPI_OPT_WSCALE
 		}
 		switch v.CcState {
 		case tcpip.RTORecovery:
@@ -1297,10 +1450,165 @@ func getSockOptTCP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name,
 		}
 		vP := primitive.Int32(v)
 		return &vP, nil
+
+	case linux.TCP_FASTOPEN, linux.TCP_FASTOPEN_CONNECT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		opt := tcpip.TCPFastOpenQueueLenOption
+		if name == linux.TCP_FASTOPEN_CONNECT {
+			opt = tcpip.TCPFastOpenConnectOption
+		}
+		v, err := ep.GetSockOptInt(opt)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
+	}
+	return nil, syserr.ErrProtocolNotAvailable
+}
+
+// getSockOptUDP implements GetSockOpt when level is SOL_UDP.
+func getSockOptUDP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name, outLen int) (marshal.Marshallable, *syserr.Error) {
+	switch name {
+	case linux.UDP_SEGMENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.UDPSegmentOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
+
+	case linux.UDP_GRO:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetUDPGRO()))
+		return &v, nil
+	}
+	return nil, syserr.ErrProtocolNotAvailable
+}
+
+// getSockOptSCTP implements GetSockOpt when level is SOL_SCTP.
+func getSockOptSCTP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, family int, name, outLen int) (marshal.Marshallable, *syserr.Error) {
+	switch name {
+	case linux.SCTP_NODELAY:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(!ep.SocketOptions().GetDelayOption()))
+		return &v, nil
+
+	case linux.SCTP_INITMSG:
+		if outLen < linux.SizeOfSCTPInitMsg {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.SCTPInitMsgOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		return &linux.SCTPInitMsg{
+			NumOutStreams:  v.NumOutStreams,
+			MaxInStreams:   v.MaxInStreams,
+			MaxAttempts:    v.MaxAttempts,
+			MaxInitTimeout: uint16(v.MaxInitTimeout / time.Millisecond),
+		}, nil
+
+	case linux.SCTP_EVENTS:
+		var v tcpip.SCTPEventsOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		// As in Linux, the structure is truncated to the length
+		// requested.
+		if outLen > linux.SizeOfSCTPEventSubscribe {
+			outLen = linux.SizeOfSCTPEventSubscribe
+		}
+		b := make([]byte, outLen)
+		for i := range b {
+			if v&(1<<i) != 0 {
+				b[i] = 1
+			}
+		}
+		bP := primitive.ByteSlice(b)
+		return &bP, nil
+
+	case linux.SCTP_STATUS:
+		if outLen < linux.SizeOfSCTPStatus {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		var v tcpip.SCTPStatusOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		status := linux.SCTPStatus{
+			State:              sctpStateToLinux(sctp.EndpointState(v.State)),
+			Rwnd:               v.Rwnd,
+			UnackData:          v.UnackedData,
+			PendData:           v.PendingData,
+			InStreams:          v.InStreams,
+			OutStreams:         v.OutStreams,
+			FragmentationPoint: v.FragmentationPoint,
+			Primary: linux.SCTPPaddrInfo{
+				// SCTP_ACTIVE; the only path is always considered
+				// reachable.
+				State: 2,
+				Cwnd:  v.Cwnd,
+				SRTT:  uint32(v.SRTT / time.Millisecond),
+				RTO:   uint32(v.RTO / time.Millisecond),
+				MTU:   v.MTU,
+			},
+		}
+		if addr, _ := socket.ConvertAddress(family, v.PrimaryAddress); addr != nil {
+			addr.MarshalBytes(status.Primary.Address[:addr.SizeBytes()])
+		}
+		return &status, nil
+
+	case linux.SCTP_SOCKOPT_BINDX_ADD, linux.SCTP_SOCKOPT_BINDX_REM, linux.SCTP_SOCKOPT_PEELOFF, linux.SCTP_SOCKOPT_PEELOFF_FLAGS,
+		linux.SCTP_SOCKOPT_CONNECTX_OLD, linux.SCTP_SOCKOPT_CONNECTX, linux.SCTP_SOCKOPT_CONNECTX3,
+		linux.SCTP_GET_PEER_ADDRS, linux.SCTP_GET_LOCAL_ADDRS, linux.SCTP_PRIMARY_ADDR, linux.SCTP_SET_PEER_PRIMARY_ADDR,
+		linux.SCTP_PR_SUPPORTED, linux.SCTP_DEFAULT_PRINFO, linux.SCTP_PR_ASSOC_STATUS:
+		// Multi-homing, one-to-many sockets and partial reliability are
+		// not supported.
+		return nil, syserr.ErrNotSupported
 	}
 	return nil, syserr.ErrProtocolNotAvailable
 }
 
+// sctpStateToLinux returns the SCTP_STATUS state of an SCTP endpoint.
+func sctpStateToLinux(state sctp.EndpointState) int32 {
+	switch state {
+	case sctp.StateCookieWait:
+		return linux.SCTP_COOKIE_WAIT
+	case sctp.StateCookieEchoed:
+		return linux.SCTP_COOKIE_ECHOED
+	case sctp.StateEstablished:
+		return linux.SCTP_ESTABLISHED
+	case sctp.StateShutdownPending:
+		return linux.SCTP_SHUTDOWN_PENDING
+	case sctp.StateShutdownSent:
+		return linux.SCTP_SHUTDOWN_SENT
+	case sctp.StateShutdownReceived:
+		return linux.SCTP_SHUTDOWN_RECEIVED
+	case sctp.StateShutdownAckSent:
+		return linux.SCTP_SHUTDOWN_ACK_SENT
+	case sctp.StateClosed:
+		return linux.SCTP_CLOSED
+	default:
+		return linux.SCTP_EMPTY
+	}
+}
+
 func getSockOptICMPv6(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name int, outLen int) (marshal.Marshallable, *syserr.Error) {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
 		log.Warningf("SOL_ICMPV6 options not supported on endpoints other than tcpip.Endpoint: option = %d", name)
@@ -1444,6 +1752,22 @@ func getSockOptIPv6(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetIPv6RecvError()))
 		return &v, nil
 
+	case linux.IPV6_FREEBIND:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetFreeBind()))
+		return &v, nil
+
+	case linux.IPV6_TRANSPARENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetTransparent()))
+		return &v, nil
+
 	case linux.IPV6_RECVORIGDSTADDR:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1532,6 +1856,22 @@ func getSockOptIPv6(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name
 			return nil, err
 		}
 		return &ret, nil
+
+	case linux.IP6T_SO_GET_REVISION_MATCH:
+		if outLen < linux.SizeOfXTGetRevision {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		// Only valid for raw IPv6 sockets.
+		if skType != linux.SOCK_RAW {
+			return nil, syserr.ErrProtocolNotAvailable
+		}
+
+		ret, err := netfilter.MatchRevision(t, outPtr)
+		if err != nil {
+			return nil, err
+		}
+		return &ret, nil
 	}
 	return nil, syserr.ErrProtocolNotAvailable
 }
@@ -1641,6 +1981,22 @@ func getSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetIPv4RecvError()))
 		return &v, nil
 
+	case linux.IP_FREEBIND:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetFreeBind()))
+		return &v, nil
+
+	case linux.IP_TRANSPARENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetTransparent()))
+		return &v, nil
+
 	case linux.IP_PKTINFO:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1737,6 +2093,22 @@ func getSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 			return nil, err
 		}
 		return &ret, nil
+
+	case linux.IPT_SO_GET_REVISION_MATCH:
+		if outLen < linux.SizeOfXTGetRevision {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		// Only valid for raw IPv4 sockets.
+		if family, skType, _ := s.Type(); family != linux.AF_INET || skType != linux.SOCK_RAW {
+			return nil, syserr.ErrProtocolNotAvailable
+		}
+
+		ret, err := netfilter.MatchRevision(t, outPtr)
+		if err != nil {
+			return nil, err
+		}
+		return &ret, nil
 	}
 	return nil, syserr.ErrProtocolNotAvailable
 }
@@ -1791,13 +2163,27 @@ func SetSockOpt(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, level int
 		return setSockOptIP(t, s, ep, name, optVal)
 
 	case linux.SOL_PACKET:
-		// gVisor doesn't support any SOL_PACKET options just return not
-		// supported. Returning nil here will result in tcpdump thinking AF_PACKET
+		if ps, ok := s.(packetSockOpts); ok {
+			if family, _, _ := s.Type(); family == linux.AF_PACKET {
+				return ps.setSockOptPacket(t, name, optVal)
+			}
+		}
+		// Returning nil here will result in tcpdump thinking AF_PACKET
 		// features are supported and proceed to use them and break.
 		return syserr.ErrProtocolNotAvailable
 
-	case linux.SOL_UDP,
-		linux.SOL_RAW:
+	case linux.SOL_UDP:
+		if _, skType, skProto := s.Type(); isUDPSocket(skType, skProto) {
+			return setSockOptUDP(t, s, ep, name, optVal)
+		}
+
+	case linux.SOL_SCTP:
+		if _, skType, skProto := s.Type(); isSCTPSocket(skType, skProto) {
+			return setSockOptSCTP(t, s, ep, name, optVal)
+		}
+		return syserr.ErrProtocolNotAvailable
+
+	case linux.SOL_RAW:
 		// Not supported.
 	}
 
@@ -1973,6 +2359,41 @@ func setSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, nam
 		ep.SocketOptions().SetNoChecksum(v != 0)
 		return nil
 
+	case linux.SO_ZEROCOPY:
+		// MSG_ZEROCOPY is only supported by TCP sockets.
+		if _, skType, skProto := s.Type(); !isTCPSocket(skType, skProto) {
+			return syserr.ErrNotSupported
+		}
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+		if v < 0 || v > 1 {
+			return syserr.ErrInvalidArgument
+		}
+		ep.SocketOptions().SetZeroCopy(v != 0)
+		return nil
+
+	case linux.SO_TIMESTAMPING:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		// The option is either an int or a struct so_timestamping.
+		var v linux.SoTimestamping
+		if len(optVal) >= linux.SizeOfSoTimestamping {
+			v.UnmarshalBytes(optVal)
+		} else {
+			v.Flags = int32(hostarch.ByteOrder.Uint32(optVal))
+		}
+		// Binding to a PTP hardware clock isn't supported, since hardware
+		// timestamps are never generated.
+		if v.Flags&^linux.SOF_TIMESTAMPING_MASK != 0 || v.Flags&linux.SOF_TIMESTAMPING_BIND_PHC != 0 {
+			return syserr.ErrInvalidArgument
+		}
+		return syserr.TranslateNetstackError(ep.SocketOptions().SetTimestamping(tcpip.TimestampingFlags(v.Flags)))
+
 	case linux.SO_LINGER:
 		if len(optVal) < linux.SizeOfLinger {
 			return syserr.ErrInvalidArgument
@@ -1987,10 +2408,30 @@ func setSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, nam
 		})
 		return nil
 
+	case linux.SO_ATTACH_FILTER:
+		// Filters are run over the packets received by packet, raw and UDP
+		// sockets only.
+		filter, err := copyInSocketFilter(t, optVal)
+		if err != nil {
+			return err
+		}
+		return syserr.TranslateNetstackError(ep.SocketOptions().SetFilter(filter))
+
+	case linux.SO_ATTACH_BPF:
+		// eBPF programs aren't supported.
+		return syserr.ErrProtocolNotAvailable
+
 	case linux.SO_DETACH_FILTER:
 		// optval is ignored.
-		var v tcpip.SocketDetachFilterOption
-		return syserr.TranslateNetstackError(ep.SetSockOpt(&v))
+		return syserr.TranslateNetstackError(ep.SocketOptions().DetachFilter())
+
+	case linux.SO_LOCK_FILTER:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := hostarch.ByteOrder.Uint32(optVal)
+		return syserr.TranslateNetstackError(ep.SocketOptions().SetFilterLocked(v != 0))
 
 	// TODO(b/226603727): Add support for SO_RCVLOWAT option. For now, only
 	// the unsupported syscall message is removed.
@@ -2002,6 +2443,66 @@ func setSockOptSocket(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, nam
 		v := hostarch.ByteOrder.Uint32(optVal)
 		ep.SocketOptions().SetRcvlowat(int32(v))
 		return nil
+
+	case linux.SO_PEEK_OFF:
+		if family, _, _ := s.Type(); family != linux.AF_UNIX {
+			return syserr.ErrNotSupported
+		}
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.PeekOffsetOption, int(v)))
+
+	case linux.SO_MAX_PACING_RATE:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		// Like Linux, accept either a 32-bit or a 64-bit rate, where the
+		// 32-bit ~0U means unlimited.
+		var rate uint64
+		if len(optVal) >= sizeOfInt64 {
+			rate = hostarch.ByteOrder.Uint64(optVal)
+		} else if v := hostarch.ByteOrder.Uint32(optVal); v == math.MaxUint32 {
+			rate = math.MaxUint64
+		} else {
+			rate = uint64(v)
+		}
+		ep.SocketOptions().SetMaxPacingRate(rate)
+		return nil
+
+	case linux.SO_BUSY_POLL:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+		if v < 0 {
+			return syserr.ErrInvalidArgument
+		}
+		// Like Linux, only privileged users can increase the busy polling
+		// time.
+		if uint32(v) > ep.SocketOptions().GetBusyPoll() {
+			if creds := auth.CredentialsFromContext(t); !creds.HasCapability(linux.CAP_NET_ADMIN) {
+				return syserr.ErrNotPermitted
+			}
+		}
+		ep.SocketOptions().SetBusyPoll(uint32(v))
+		return nil
+
+	case linux.SO_INCOMING_CPU:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		ep.SocketOptions().SetIncomingCPU(int32(hostarch.ByteOrder.Uint32(optVal)))
+		return nil
+
+	case linux.SO_INCOMING_NAPI_ID:
+		// The NAPI ID can only be read.
+		return syserr.ErrProtocolNotAvailable
 	}
 
 	return nil
@@ -2140,6 +2641,30 @@ func setSockOptTCP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name i
 
 		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.TCPWindowClampOption, int(v)))
 
+	case linux.TCP_FASTOPEN:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.TCPFastOpenQueueLenOption, int(v)))
+
+	case linux.TCP_FASTOPEN_CONNECT:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.TCPFastOpenConnectOption, int(v)))
+
+	case linux.TCP_MD5SIG, linux.TCP_MD5SIG_EXT:
+		var v linux.TCPMD5Sig
+		if len(optVal) < v.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		v.UnmarshalUnsafe(optVal)
+		return setTCPMD5Sig(s, ep, name == linux.TCP_MD5SIG_EXT, &v)
+
 	case linux.TCP_REPAIR_OPTIONS:
 		// Not supported.
 	}
@@ -2147,6 +2672,150 @@ func setSockOptTCP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name i
 	return nil
 }
 
+// setSockOptUDP implements SetSockOpt when level is SOL_UDP.
+func setSockOptUDP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
+	switch name {
+	case linux.UDP_SEGMENT:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.UDPSegmentOption, int(v)))
+
+	case linux.UDP_GRO:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := hostarch.ByteOrder.Uint32(optVal)
+		ep.SocketOptions().SetUDPGRO(v != 0)
+		return nil
+	}
+
+	return nil
+}
+
+// setSockOptSCTP implements SetSockOpt when level is SOL_SCTP.
+func setSockOptSCTP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
+	switch name {
+	case linux.SCTP_NODELAY:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := hostarch.ByteOrder.Uint32(optVal)
+		ep.SocketOptions().SetDelayOption(v == 0)
+		return nil
+
+	case linux.SCTP_INITMSG:
+		var v linux.SCTPInitMsg
+		if len(optVal) < v.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		v.UnmarshalUnsafe(optVal)
+
+		return syserr.TranslateNetstackError(ep.SetSockOpt(&tcpip.SCTPInitMsgOption{
+			NumOutStreams:  v.NumOutStreams,
+			MaxInStreams:   v.MaxInStreams,
+			MaxAttempts:    v.MaxAttempts,
+			MaxInitTimeout: time.Duration(v.MaxInitTimeout) * time.Millisecond,
+		}))
+
+	case linux.SCTP_EVENTS:
+		if len(optVal) > linux.SizeOfSCTPEventSubscribe {
+			return syserr.ErrInvalidArgument
+		}
+
+		// Fields beyond the length given are left unchanged.
+		var v tcpip.SCTPEventsOption
+		if err := ep.GetSockOpt(&v); err != nil {
+			return syserr.TranslateNetstackError(err)
+		}
+		for i, b := range optVal {
+			if b != 0 {
+				v |= 1 << i
+			} else {
+				v &^= 1 << i
+			}
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOpt(&v))
+
+	case linux.SCTP_SOCKOPT_BINDX_ADD, linux.SCTP_SOCKOPT_BINDX_REM, linux.SCTP_SOCKOPT_PEELOFF, linux.SCTP_SOCKOPT_PEELOFF_FLAGS,
+		linux.SCTP_SOCKOPT_CONNECTX_OLD, linux.SCTP_SOCKOPT_CONNECTX, linux.SCTP_SOCKOPT_CONNECTX3,
+		linux.SCTP_PRIMARY_ADDR, linux.SCTP_SET_PEER_PRIMARY_ADDR,
+		linux.SCTP_PR_SUPPORTED, linux.SCTP_DEFAULT_PRINFO:
+		// Multi-homing, one-to-many sockets and partial reliability are
+		// not supported.
+		return syserr.ErrNotSupported
+	}
+
+	return syserr.ErrProtocolNotAvailable
+}
+
+// setTCPMD5Sig implements setsockopt(TCP_MD5SIG) and
+// setsockopt(TCP_MD5SIG_EXT).
+func setTCPMD5Sig(s socket.SocketOps, ep commonEndpoint, ext bool, v *linux.TCPMD5Sig) *syserr.Error {
+	sockFamily, _, _ := s.Type()
+	addr, family, err := socket.AddressAndFamily(v.Addr[:])
+	if err != nil {
+		return err
+	}
+	if int(family) != sockFamily {
+		return syserr.ErrInvalidArgument
+	}
+	var addrLen int
+	switch family {
+	case linux.AF_INET:
+		addrLen = header.IPv4AddressSize
+	case linux.AF_INET6:
+		addrLen = header.IPv6AddressSize
+	default:
+		return syserr.ErrInvalidArgument
+	}
+	if len(addr.Addr) == 0 {
+		// AddressAndFamily returns the unspecified address as an empty
+		// address.
+		addr.Addr = tcpip.Address(make([]byte, addrLen))
+	}
+
+	prefixLen := addrLen * 8
+	var flags uint8
+	if ext {
+		flags = v.Flags
+	}
+	if flags&linux.TCP_MD5SIG_FLAG_PREFIX != 0 {
+		prefixLen = int(v.PrefixLen)
+		if prefixLen > addrLen*8 {
+			return syserr.ErrInvalidArgument
+		}
+	}
+	if flags&linux.TCP_MD5SIG_FLAG_IFINDEX != 0 && v.IfIndex != 0 {
+		// Keys bound to devices are not supported.
+		return syserr.ErrInvalidArgument
+	}
+	if v.KeyLen > linux.TCP_MD5SIG_MAXKEYLEN {
+		return syserr.ErrInvalidArgument
+	}
+
+	// As in Linux, keys for v4-mapped addresses apply to IPv4 peers of
+	// dual-stack sockets.
+	if header.IsV4MappedAddress(addr.Addr) {
+		if prefixLen < 96 {
+			return syserr.ErrInvalidArgument
+		}
+		addr.Addr = addr.Addr.To4()
+		prefixLen -= 96
+	}
+
+	opt := tcpip.TCPMD5SigOption{
+		Addr:      addr.Addr,
+		PrefixLen: prefixLen,
+		Key:       v.Key[:v.KeyLen],
+	}
+	return syserr.TranslateNetstackError(ep.SetSockOpt(&opt))
+}
+
 func setSockOptICMPv6(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
 		log.Warningf("SOL_ICMPV6 options not supported on endpoints other than tcpip.Endpoint: option = %d", name)
@@ -2314,6 +2983,30 @@ func setSockOptIPv6(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name
 		ep.SocketOptions().SetIPv6RecvError(v != 0)
 		return nil
 
+	case linux.IPV6_FREEBIND:
+		if len(optVal) == 0 {
+			return nil
+		}
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+		ep.SocketOptions().SetFreeBind(v != 0)
+		return nil
+
+	case linux.IPV6_TRANSPARENT:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			if creds := auth.CredentialsFromContext(t); !creds.HasCapability(linux.CAP_NET_ADMIN) && !creds.HasCapability(linux.CAP_NET_RAW) {
+				return syserr.ErrNotPermitted
+			}
+		}
+		ep.SocketOptions().SetTransparent(v != 0)
+		return nil
+
 	case linux.IP6T_SO_SET_REPLACE:
 		if len(optVal) < linux.SizeOfIP6TReplace {
 			return syserr.ErrInvalidArgument
@@ -2527,6 +3220,30 @@ func setSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 		ep.SocketOptions().SetIPv4RecvError(v != 0)
 		return nil
 
+	case linux.IP_FREEBIND:
+		if len(optVal) == 0 {
+			return nil
+		}
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+		ep.SocketOptions().SetFreeBind(v != 0)
+		return nil
+
+	case linux.IP_TRANSPARENT:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			if creds := auth.CredentialsFromContext(t); !creds.HasCapability(linux.CAP_NET_ADMIN) && !creds.HasCapability(linux.CAP_NET_RAW) {
+				return syserr.ErrNotPermitted
+			}
+		}
+		ep.SocketOptions().SetTransparent(v != 0)
+		return nil
+
 	case linux.IP_PKTINFO:
 		if len(optVal) == 0 {
 			return nil
@@ -2587,7 +3304,6 @@ func setSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 		linux.IP_BLOCK_SOURCE,
 		linux.IP_CHECKSUM,
 		linux.IP_DROP_SOURCE_MEMBERSHIP,
-		linux.IP_FREEBIND,
 		linux.IP_IPSEC_POLICY,
 		linux.IP_MINTTL,
 		linux.IP_MSFILTER,
@@ -2599,7 +3315,6 @@ func setSockOptIP(t *kernel.Task, s socket.SocketOps, ep commonEndpoint, name in
 		linux.IP_RECVFRAGSIZE,
 		linux.IP_RECVOPTS,
 		linux.IP_RETOPTS,
-		linux.IP_TRANSPARENT,
 		linux.IP_UNBLOCK_SOURCE,
 		linux.IP_UNICAST_IF,
 		linux.IP_XFRM_POLICY,
@@ -2709,6 +3424,9 @@ func (s *socketOpsCommon) nonBlockingRead(ctx context.Context, dst usermem.IOSeq
 	}
 	// Set the control message, even if 0 bytes were read.
 	s.updateTimestamp(res.ControlMessages)
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		s.Endpoint.SocketOptions().SetIncomingCPU(t.CPU())
+	}
 
 	if isPacket {
 		var addr linux.SockAddr
@@ -2755,9 +3473,16 @@ func (s *socketOpsCommon) nonBlockingRead(ctx context.Context, dst usermem.IOSeq
 		s.Endpoint.ModerateRecvBuf(n)
 	}
 
+	// SCTP sockets preserve message boundaries, which are reported with
+	// MSG_EOR.
+	var flags int
+	if res.EndOfRecord && isSCTPSocket(s.skType, s.protocol) {
+		flags |= linux.MSG_EOR
+	}
+
 	cmsg := s.netstackToLinuxControlMessages(res.ControlMessages)
 	s.fillCmsgInq(&cmsg)
-	return res.Count, 0, nil, 0, cmsg, syserr.TranslateNetstackError(err)
+	return res.Count, flags, nil, 0, cmsg, syserr.TranslateNetstackError(err)
 }
 
 func (s *socketOpsCommon) netstackToLinuxControlMessages(cm tcpip.ReceivableControlMessages) socket.ControlMessages {
@@ -2765,6 +3490,7 @@ func (s *socketOpsCommon) netstackToLinuxControlMessages(cm tcpip.ReceivableCont
 	return socket.ControlMessages{
 		IP: socket.IPControlMessages{
 			HasTimestamp:       readCM.HasTimestamp && s.sockOptTimestamp,
+			HasTimestamping:    readCM.HasTimestamp && s.Endpoint.SocketOptions().GetTimestamping().ReportRXTimestamp(),
 			Timestamp:          readCM.Timestamp,
 			HasInq:             readCM.HasInq,
 			Inq:                readCM.Inq,
@@ -2780,19 +3506,37 @@ func (s *socketOpsCommon) netstackToLinuxControlMessages(cm tcpip.ReceivableCont
 			PacketInfo:         readCM.PacketInfo,
 			HasIPv6PacketInfo:  readCM.HasIPv6PacketInfo,
 			IPv6PacketInfo:     readCM.IPv6PacketInfo,
+			HasGROSize:         readCM.HasGROSize,
+			GROSize:            readCM.GROSize,
 			OriginalDstAddress: readCM.OriginalDstAddress,
 			SockErr:            readCM.SockErr,
+			HasSCTPSndRcvInfo:  readCM.HasSCTPSndRcvInfo,
+			SCTPSndRcvInfo:     readCM.SCTPSndRcvInfo,
 		},
 	}
 }
 
 func (s *socketOpsCommon) linuxToNetstackControlMessages(cm socket.ControlMessages) tcpip.SendableControlMessages {
-	return tcpip.SendableControlMessages{
+	scm := tcpip.SendableControlMessages{
 		HasTTL:      cm.IP.HasTTL,
 		TTL:         uint8(cm.IP.TTL),
 		HasHopLimit: cm.IP.HasHopLimit,
 		HopLimit:    uint8(cm.IP.HopLimit),
+		HasGSOSize:  cm.IP.HasGSOSize,
+		GSOSize:     cm.IP.GSOSize,
+	}
+	if cm.IP.HasSCTPSndRcvInfo {
+		info := &cm.IP.SCTPSndRcvInfo
+		scm.HasSCTPSndRcvInfo = true
+		scm.SCTPSndRcvInfo = tcpip.SCTPSndRcvInfo{
+			Stream:    info.Stream,
+			Unordered: info.Flags&linux.SCTP_UNORDERED != 0,
+			PPID:      socket.Ntohl(info.PPID),
+			Abort:     info.Flags&linux.SCTP_ABORT != 0,
+			EOF:       info.Flags&linux.SCTP_EOF != 0,
+		}
 	}
+	return scm
 }
 
 // updateTimestamp sets the timestamp for SIOCGSTAMP. It should be called after
@@ -2856,13 +3600,43 @@ func (s *socketOpsCommon) recvErr(t *kernel.Task, dst usermem.IOSequence) (int,
 	}
 	n, err := dst.CopyOut(t, sockErr.Payload.AsSlice())
 
+	ts, isTimestamp := sockErr.Cause.(*tcpip.TimestampingSockError)
+	if isTimestamp {
+		// Transmit timestamps are reported in the format of the socket's
+		// family, like MSG_ZEROCOPY notifications.
+		sockErr.NetProto = s.netProto()
+	}
+	cmgs := socket.ControlMessages{IP: socket.NewIPControlMessages(s.family, tcpip.ReceivableControlMessages{SockErr: sockErr})}
+	if isTimestamp {
+		if s.Endpoint.SocketOptions().GetTimestamping()&tcpip.TimestampingSoftware != 0 {
+			cmgs.IP.HasTimestamping = true
+			cmgs.IP.Timestamp = ts.Timestamp
+		}
+		return n, msgFlags, nil, 0, cmgs, syserr.FromError(err)
+	}
+	// MSG_ZEROCOPY notifications aren't associated with a datagram, so there
+	// is no address.
+	if sockErr.Cause.Origin() == tcpip.SockExtErrorOriginZeroCopy {
+		return n, msgFlags, nil, 0, cmgs, syserr.FromError(err)
+	}
+
 	// The original destination address of the datagram that caused the error is
 	// supplied via msg_name.  -- recvmsg(2)
 	dstAddr, dstAddrLen := socket.ConvertAddress(addrFamilyFromNetProto(sockErr.NetProto), sockErr.Dst)
-	cmgs := socket.ControlMessages{IP: socket.NewIPControlMessages(s.family, tcpip.ReceivableControlMessages{SockErr: sockErr})}
 	return n, msgFlags, dstAddr, dstAddrLen, cmgs, syserr.FromError(err)
 }
 
+// BusyPollUsec implements kernel.BusyPoller.BusyPollUsec.
+func (s *socketOpsCommon) BusyPollUsec() uint32 {
+	return s.Endpoint.SocketOptions().GetBusyPoll()
+}
+
+// busyPollReady returns true if s is readable. It is polled by blocking reads
+// that busy poll.
+func (s *socketOpsCommon) busyPollReady() bool {
+	return s.Endpoint.Readiness(waiter.ReadableEvents) != 0
+}
+
 // RecvMsg implements the linux syscall recvmsg(2) for sockets backed by
 // tcpip.Endpoint.
 func (s *socketOpsCommon) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, senderRequested bool, _ uint64) (n int, msgFlags int, senderAddr linux.SockAddr, senderAddrLen uint32, controlMessages socket.ControlMessages, err *syserr.Error) {
@@ -2890,7 +3664,7 @@ func (s *socketOpsCommon) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 		return 0, 0, nil, 0, socket.ControlMessages{}, err
 	}
 
-	if err == nil && (dontWait || !waitAll || s.isPacketBased() || int64(n) >= dst.NumBytes()) {
+	if err == nil && (dontWait || !waitAll || s.isPacketBased() || msgFlags&linux.MSG_EOR != 0 || int64(n) >= dst.NumBytes()) {
 		// We got all the data we need.
 		return
 	}
@@ -2904,6 +3678,7 @@ func (s *socketOpsCommon) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 	s.EventRegister(&e)
 	defer s.EventUnregister(&e)
 
+	busyPolled := false
 	for {
 		var rn int
 		rn, msgFlags, senderAddr, senderAddrLen, controlMessages, err = s.nonBlockingRead(t, dst, peek, trunc, senderRequested)
@@ -2917,12 +3692,20 @@ func (s *socketOpsCommon) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags
 			}
 			return
 		}
-		if err == nil && (s.isPacketBased() || !waitAll || int64(rn) >= dst.NumBytes()) {
+		if err == nil && (s.isPacketBased() || !waitAll || msgFlags&linux.MSG_EOR != 0 || int64(rn) >= dst.NumBytes()) {
 			// We got all the data we need.
 			return
 		}
 		dst = dst.DropFirst(rn)
 
+		// Busy poll before the first sleep, if SO_BUSY_POLL is set.
+		if !busyPolled {
+			busyPolled = true
+			if t.BusyPoll(s.BusyPollUsec(), s.busyPollReady) {
+				continue
+			}
+		}
+
 		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
 			if n > 0 {
 				return n, msgFlags, senderAddr, senderAddrLen, controlMessages, nil
@@ -2961,18 +3744,38 @@ func (s *socketOpsCommon) SendMsg(t *kernel.Task, src usermem.IOSequence, to []b
 		To:              addr,
 		More:            flags&linux.MSG_MORE != 0,
 		EndOfRecord:     flags&linux.MSG_EOR != 0,
+		FastOpen:        flags&linux.MSG_FASTOPEN != 0,
 		ControlMessages: s.linuxToNetstackControlMessages(controlMessages),
 	}
 
+	var total int64
+	// As in Linux, MSG_ZEROCOPY is ignored unless SO_ZEROCOPY is set.
+	if so := s.Endpoint.SocketOptions(); flags&linux.MSG_ZEROCOPY != 0 && so.GetZeroCopy() && src.NumBytes() != 0 {
+		prs, err := pinSendBuffer(t, src)
+		if err != nil {
+			return 0, syserr.FromError(err)
+		}
+		defer unpinSendBuffer(t, prs)
+
+		opts.ZeroCopy = true
+		opts.ZeroCopyID = so.StartZeroCopySend(s.netProto())
+		defer func() {
+			if so.FinishZeroCopySend(opts.ZeroCopyID, total != 0) {
+				s.Notify(waiter.EventErr)
+			}
+		}()
+	}
+
 	r := src.Reader(t)
 	var (
-		total int64
 		entry waiter.Entry
 		ch    <-chan struct{}
 	)
 	for {
 		n, err := s.Endpoint.Write(r, opts)
 		total += n
+		// Only the first write may initiate a connection.
+		opts.FastOpen = false
 		if flags&linux.MSG_DONTWAIT != 0 {
 			return int(total), syserr.TranslateNetstackError(err)
 		}
@@ -2980,7 +3783,9 @@ func (s *socketOpsCommon) SendMsg(t *kernel.Task, src usermem.IOSequence, to []b
 		switch err.(type) {
 		case nil:
 			block = total != src.NumBytes()
-		case *tcpip.ErrWouldBlock:
+		case *tcpip.ErrWouldBlock, *tcpip.ErrConnectStarted:
+			// A connection initiated by MSG_FASTOPEN without
+			// sending data is writable once established.
 		default:
 			block = false
 		}
@@ -3009,6 +3814,58 @@ func (s *socketOpsCommon) SendMsg(t *kernel.Task, src usermem.IOSequence, to []b
 	}
 }
 
+// netProto returns the network protocol that determines the format of socket
+// errors for s.
+func (s *socketOpsCommon) netProto() tcpip.NetworkProtocolNumber {
+	if s.family == linux.AF_INET6 {
+		return header.IPv6ProtocolNumber
+	}
+	return header.IPv4ProtocolNumber
+}
+
+// pinSendBuffer pins the pages of src for a MSG_ZEROCOPY send, like
+// get_user_pages() in Linux, and charges them to t's memory manager.
+//
+// The data is copied into the endpoint's send queue before SendMsg returns, so
+// the pages only need to stay pinned until then.
+func pinSendBuffer(t *kernel.Task, src usermem.IOSequence) ([]mm.PinnedRange, error) {
+	var prs []mm.PinnedRange
+	for ars := src.Addrs; !ars.IsEmpty(); ars = ars.Tail() {
+		ar := ars.Head()
+		if ar.Length() == 0 {
+			continue
+		}
+		end, ok := ar.End.RoundUp()
+		if !ok {
+			mm.Unpin(prs)
+			return nil, linuxerr.EFAULT
+		}
+		ar = hostarch.AddrRange{ar.Start.RoundDown(), end}
+		pinned, err := t.MemoryManager().Pin(t, ar, hostarch.Read, false /* ignorePermissions */)
+		prs = append(prs, pinned...)
+		if err != nil {
+			mm.Unpin(prs)
+			return nil, err
+		}
+	}
+	t.MemoryManager().IncPinnedMemory(pinnedLength(prs))
+	return prs, nil
+}
+
+// unpinSendBuffer releases pages pinned by pinSendBuffer.
+func unpinSendBuffer(t *kernel.Task, prs []mm.PinnedRange) {
+	t.MemoryManager().DecPinnedMemory(pinnedLength(prs))
+	mm.Unpin(prs)
+}
+
+func pinnedLength(prs []mm.PinnedRange) uint64 {
+	var n uint64
+	for _, pr := range prs {
+		n += uint64(pr.Source.Length())
+	}
+	return n
+}
+
 // Ioctl implements fs.FileOperations.Ioctl.
 func (s *SocketOperations) Ioctl(ctx context.Context, _ *fs.File, io usermem.IO, args arch.SyscallArguments) (uintptr, error) {
 	return s.socketOpsCommon.ioctl(ctx, io, args)
@@ -3365,10 +4222,46 @@ func isUDPSocket(skType linux.SockType, skProto int) bool {
 	return skType == linux.SOCK_DGRAM && (skProto == 0 || skProto == unix.IPPROTO_UDP)
 }
 
+func isSCTPSocket(skType linux.SockType, skProto int) bool {
+	return skType == linux.SOCK_STREAM && skProto == unix.IPPROTO_SCTP
+}
+
 func isICMPSocket(skType linux.SockType, skProto int) bool {
 	return skType == linux.SOCK_DGRAM && (skProto == unix.IPPROTO_ICMP || skProto == unix.IPPROTO_ICMPV6)
 }
 
+// LinuxTCPState translates the state of a netstack TCP endpoint to the value
+// defined by Linux.
+func LinuxTCPState(state tcp.EndpointState) uint32 {
+	switch state {
+	case tcp.StateEstablished:
+		return linux.TCP_ESTABLISHED
+	case tcp.StateSynSent:
+		return linux.TCP_SYN_SENT
+	case tcp.StateSynRecv:
+		return linux.TCP_SYN_RECV
+	case tcp.StateFinWait1:
+		return linux.TCP_FIN_WAIT1
+	case tcp.StateFinWait2:
+		return linux.TCP_FIN_WAIT2
+	case tcp.StateTimeWait:
+		return linux.TCP_TIME_WAIT
+	case tcp.StateClose, tcp.StateInitial, tcp.StateBound, tcp.StateConnecting, tcp.StateError:
+		return linux.TCP_CLOSE
+	case tcp.StateCloseWait:
+		return linux.TCP_CLOSE_WAIT
+	case tcp.StateLastAck:
+		return linux.TCP_LAST_ACK
+	case tcp.StateListen:
+		return linux.TCP_LISTEN
+	case tcp.StateClosing:
+		return linux.TCP_CLOSING
+	default:
+		// Internal or unknown state.
+		return 0
+	}
+}
+
 // State implements socket.Socket.State. State translates the internal state
 // returned by netstack to values defined by Linux.
 func (s *socketOpsCommon) State() uint32 {
@@ -3380,33 +4273,7 @@ func (s *socketOpsCommon) State() uint32 {
 	switch {
 	case isTCPSocket(s.skType, s.protocol):
 		// TCP socket.
-		switch tcp.EndpointState(s.Endpoint.State()) {
-		case tcp.StateEstablished:
-			return linux.TCP_ESTABLISHED
-		case tcp.StateSynSent:
-			return linux.TCP_SYN_SENT
-		case tcp.StateSynRecv:
-			return linux.TCP_SYN_RECV
-		case tcp.StateFinWait1:
-			return linux.TCP_FIN_WAIT1
-		case tcp.StateFinWait2:
-			return linux.TCP_FIN_WAIT2
-		case tcp.StateTimeWait:
-			return linux.TCP_TIME_WAIT
-		case tcp.StateClose, tcp.StateInitial, tcp.StateBound, tcp.StateConnecting, tcp.StateError:
-			return linux.TCP_CLOSE
-		case tcp.StateCloseWait:
-			return linux.TCP_CLOSE_WAIT
-		case tcp.StateLastAck:
-			return linux.TCP_LAST_ACK
-		case tcp.StateListen:
-			return linux.TCP_LISTEN
-		case tcp.StateClosing:
-			return linux.TCP_CLOSING
-		default:
-			// Internal or unknown state.
-			return 0
-		}
+		return LinuxTCPState(tcp.EndpointState(s.Endpoint.State()))
 	case isUDPSocket(s.skType, s.protocol):
 		// UDP socket.
 		switch transport.DatagramEndpointState(s.Endpoint.State()) {
@@ -3417,6 +4284,18 @@ func (s *socketOpsCommon) State() uint32 {
 		default:
 			return 0
 		}
+	case isSCTPSocket(s.skType, s.protocol):
+		// SCTP socket. As in Linux, the socket state follows TCP's.
+		switch sctp.EndpointState(s.Endpoint.State()) {
+		case sctp.StateListen:
+			return linux.TCP_LISTEN
+		case sctp.StateEstablished:
+			return linux.TCP_ESTABLISHED
+		case sctp.StateShutdownPending, sctp.StateShutdownSent, sctp.StateShutdownReceived, sctp.StateShutdownAckSent:
+			return linux.TCP_CLOSING
+		default:
+			return linux.TCP_CLOSE
+		}
 	case isICMPSocket(s.skType, s.protocol):
 		// TODO(b/112063468): Export states for ICMP sockets.
 	case s.skType == linux.SOCK_RAW:
@@ -15,6 +15,8 @@
 package netstack
 
 import (
+	"io"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -24,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/sockfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/socket"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/syserr"
@@ -52,6 +55,7 @@ func NewVFS2(t *kernel.Task, family int, skType linux.SockType, protocol int, qu
 	if skType == linux.SOCK_STREAM {
 		endpoint.SocketOptions().SetDelayOption(true)
 	}
+	endpoint.SocketOptions().SetBusyPoll(t.Kernel().NetBusyRead())
 
 	mnt := t.Kernel().SocketMount()
 	d := sockfs.NewDentry(t, mnt)
@@ -105,6 +109,18 @@ func (s *SocketVFS2) Epollable() bool {
 	return true
 }
 
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap. Only packet
+// sockets with a ring configured by PACKET_RX_RING may be mapped.
+func (s *SocketVFS2) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	s.packetMu.Lock()
+	r := s.rxRing
+	s.packetMu.Unlock()
+	if r == nil {
+		return linuxerr.EINVAL
+	}
+	return vfs.GenericConfigureMMap(&s.vfsfd, r, opts)
+}
+
 // Read implements vfs.FileDescriptionImpl.
 func (s *SocketVFS2) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
 	// All flags other than RWF_NOWAIT should be ignored.
@@ -150,6 +166,40 @@ func (s *SocketVFS2) Write(ctx context.Context, src usermem.IOSequence, opts vfs
 	return n, nil
 }
 
+// ReadFrom writes up to count bytes read from r to the socket. Data is read
+// from r directly into the endpoint's send buffer, so ReadFrom avoids the
+// intermediate copy made by Write. At most as much data as fits in the send
+// buffer is read.
+//
+// Unlike fs.FileOperations.ReadFrom, locks may be released while reading from
+// r, so r may be read beyond the returned count if the available space in the
+// send buffer shrinks concurrently. Callers must only consume the returned
+// number of bytes from their source.
+func (s *SocketVFS2) ReadFrom(ctx context.Context, r io.Reader, count int64) (int64, error) {
+	f := limitedPayloader{
+		inner: io.LimitedReader{
+			R: r,
+			N: count,
+		},
+	}
+	n, err := s.Endpoint.Write(&f, tcpip.WriteOptions{})
+	if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+		return 0, linuxerr.ErrWouldBlock
+	}
+	if _, ok := err.(*tcpip.ErrBadBuffer); ok {
+		return n, f.err
+	}
+	if err != nil {
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+
+	if n < count {
+		return n, linuxerr.ErrWouldBlock
+	}
+
+	return n, nil
+}
+
 // Accept implements the linux syscall accept(2) for sockets backed by
 // tcpip.Endpoint.
 func (s *SocketVFS2) Accept(t *kernel.Task, peerRequested bool, flags int, blocking bool) (int32, linux.SockAddr, uint32, *syserr.Error) {
@@ -0,0 +1,655 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/packet"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// blockHeaderLen is the length of a TPACKET_V3 block header, the
+	// equivalent of Linux's net/packet/af_packet.c:BLK_HDR_LEN.
+	blockHeaderLen = 48
+
+	// frameHeaderLen is the offset of the struct sockaddr_ll following each
+	// struct tpacket3_hdr in a block.
+	frameHeaderLen = 48
+
+	// frameAlign is the alignment of frames within a block, the equivalent
+	// of Linux's net/packet/af_packet.c:V3_ALIGNMENT.
+	frameAlign = 8
+
+	// defaultRetireBlockTimeout is the block retire timeout used when the
+	// application doesn't specify one. Linux derives it from the link speed;
+	// this is the value it uses for links of 1Gbps and faster.
+	defaultRetireBlockTimeout = 8 * time.Millisecond
+
+	// maxRingSize bounds the memory that an application may allocate for a
+	// ring.
+	maxRingSize = 1 << 30
+)
+
+func alignUp(x, align uint32) uint32 {
+	return (x + align - 1) &^ (align - 1)
+}
+
+// packetRing is a TPACKET_V3 receive ring (PACKET_RX_RING) for a packet
+// socket. The ring lives in sentry memory and is divided into blocks that are
+// handed between the sentry and the application through each block's
+// block_status field. The sentry fills the open block with received packets
+// and retires it to the application when it is full or when its retire timer
+// expires, at which point the next block is opened if the application has
+// returned it.
+//
+// packetRing implements memmap.Mappable, packet.ReceiveHandler and
+// ktime.Listener.
+//
+// Lock order: packetRing.mu is taken with the packet endpoint's receive lock
+// held (for packet delivery and readiness checks) and with ktime.Timer.mu held
+// (for block retirement), so it must not acquire either.
+//
+// +stateify savable
+type packetRing struct {
+	// The following fields are immutable.
+	mfp    pgalloc.MemoryFileProvider
+	fr     memmap.FileRange
+	queue  *waiter.Queue
+	cooked bool
+	req    linux.TpacketReq3
+	timer  *ktime.Timer
+
+	mu sync.Mutex `state:"nosave"`
+
+	// released is set when the ring is torn down. No new mappings of the ring
+	// may be created after then.
+	//
+	// +checklocks:mu
+	released bool
+
+	// mappings is the number of memory mappings of the ring. The ring can't
+	// be replaced while it is mapped.
+	//
+	// +checklocks:mu
+	mappings int
+
+	// cur is the index of the block being filled, or, if open is false, of
+	// the next block to be filled once the application returns it.
+	//
+	// +checklocks:mu
+	cur uint32
+
+	// open is true if block cur is owned by the sentry and being filled.
+	//
+	// +checklocks:mu
+	open bool
+
+	// hdr is the header of block cur, written to the ring when the block is
+	// retired.
+	//
+	// +checklocks:mu
+	hdr linux.TpacketBlockDesc
+
+	// lastPkt is the offset within block cur of the last packet written to
+	// it.
+	//
+	// +checklocks:mu
+	lastPkt uint32
+
+	// seq is the sequence number of the next block to be opened.
+	//
+	// +checklocks:mu
+	seq uint64
+
+	// stats holds statistics since they were last read by
+	// getsockopt(PACKET_STATISTICS).
+	//
+	// +checklocks:mu
+	stats linux.TpacketStatsV3
+}
+
+// newPacketRing creates a packet ring with the geometry req. The caller must
+// validate req with validatePacketRingReq.
+func newPacketRing(t *kernel.Task, queue *waiter.Queue, cooked bool, req linux.TpacketReq3) (*packetRing, error) {
+	mfp := pgalloc.MemoryFileProviderFromContext(t)
+	size := uint64(req.BlockSize) * uint64(req.BlockNr)
+	fr, err := mfp.MemoryFile().Allocate(size, pgalloc.AllocOpts{Kind: usage.Anonymous})
+	if err != nil {
+		return nil, err
+	}
+	r := &packetRing{
+		mfp:    mfp,
+		fr:     fr,
+		queue:  queue,
+		cooked: cooked,
+		req:    req,
+		seq:    1,
+	}
+
+	tov := time.Duration(req.RetireBlkTov) * time.Millisecond
+	if tov == 0 {
+		tov = defaultRetireBlockTimeout
+	}
+	clock := t.Kernel().MonotonicClock()
+	r.timer = ktime.NewTimer(clock, r)
+	r.timer.Swap(ktime.Setting{
+		Enabled: true,
+		Next:    clock.Now().Add(tov),
+		Period:  tov,
+	})
+	return r, nil
+}
+
+// validatePacketRingReq checks req as Linux's
+// net/packet/af_packet.c:packet_set_ring() does for TPACKET_V3.
+func validatePacketRingReq(req *linux.TpacketReq3) *syserr.Error {
+	if req.BlockSize == 0 || req.BlockSize%hostarch.PageSize != 0 {
+		return syserr.ErrInvalidArgument
+	}
+	if req.FrameSize < linux.TPACKET3_HDRLEN || req.FrameSize%linux.TPACKET_ALIGNMENT != 0 {
+		return syserr.ErrInvalidArgument
+	}
+	framesPerBlock := req.BlockSize / req.FrameSize
+	if framesPerBlock == 0 || uint64(framesPerBlock)*uint64(req.BlockNr) != uint64(req.FrameNr) {
+		return syserr.ErrInvalidArgument
+	}
+	// The block header and private area must leave room for at least one
+	// frame.
+	if req.SizeofPriv >= req.BlockSize || blockHeaderLen+uint64(alignUp(req.SizeofPriv, frameAlign))+uint64(req.FrameSize) > uint64(req.BlockSize) {
+		return syserr.ErrInvalidArgument
+	}
+	if uint64(req.BlockSize)*uint64(req.BlockNr) > maxRingSize {
+		return syserr.ErrNoMemory
+	}
+	return nil
+}
+
+func (r *packetRing) size() uint64 {
+	return r.fr.Length()
+}
+
+// firstPacketOffset returns the offset of the first packet in each block.
+func (r *packetRing) firstPacketOffset() uint32 {
+	return blockHeaderLen + alignUp(r.req.SizeofPriv, frameAlign)
+}
+
+// mapInternal returns a mapping of length bytes at off in the ring.
+func (r *packetRing) mapInternal(off, length uint64) (safemem.BlockSeq, error) {
+	return r.mfp.MemoryFile().MapInternal(memmap.FileRange{r.fr.Start + off, r.fr.Start + off + length}, hostarch.ReadWrite)
+}
+
+// writeAt writes b at off in the ring.
+func (r *packetRing) writeAt(off uint64, b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	ims, err := r.mapInternal(off, uint64(len(b)))
+	if err != nil {
+		return err
+	}
+	_, err = safemem.CopySeq(ims, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(b)))
+	return err
+}
+
+// blockStatus returns the block_status of block i.
+func (r *packetRing) blockStatus(i uint32) (uint32, error) {
+	// The block header lies within a single page, since block sizes are
+	// page-aligned.
+	ims, err := r.mapInternal(uint64(i)*uint64(r.req.BlockSize)+8, 4)
+	if err != nil {
+		return 0, err
+	}
+	return safemem.LoadUint32(ims.Head())
+}
+
+// openBlockLocked tries to open block r.cur for filling. It returns false if
+// the application still owns the block.
+//
+// +checklocks:r.mu
+func (r *packetRing) openBlockLocked() bool {
+	status, err := r.blockStatus(r.cur)
+	if err != nil {
+		log.Warningf("Failed to read packet ring block status: %v", err)
+		return false
+	}
+	if status != linux.TP_STATUS_KERNEL {
+		return false
+	}
+	r.hdr = linux.TpacketBlockDesc{
+		Version:          linux.TPACKET_V3,
+		OffsetToPriv:     blockHeaderLen,
+		OffsetToFirstPkt: r.firstPacketOffset(),
+		BlkLen:           r.firstPacketOffset(),
+		SeqNum:           r.seq,
+	}
+	r.seq++
+	r.lastPkt = 0
+	r.open = true
+	return true
+}
+
+// retireBlockLocked hands the open block over to the application and
+// advances to the next block.
+//
+// +checklocks:r.mu
+func (r *packetRing) retireBlockLocked(status uint32) {
+	blockOff := uint64(r.cur) * uint64(r.req.BlockSize)
+	if r.hdr.NumPkts != 0 {
+		// The last packet in a block has no successor.
+		var zero [4]byte
+		if err := r.writeAt(blockOff+uint64(r.lastPkt), zero[:]); err != nil {
+			log.Warningf("Failed to write packet ring frame: %v", err)
+		}
+	}
+	buf := make([]byte, r.hdr.SizeBytes())
+	r.hdr.MarshalBytes(buf)
+	if err := r.writeAt(blockOff, buf); err != nil {
+		log.Warningf("Failed to write packet ring block header: %v", err)
+	}
+	// Publish the block to the application only once its contents have been
+	// written.
+	if ims, err := r.mapInternal(blockOff+8, 4); err == nil {
+		_, err = safemem.SwapUint32(ims.Head(), linux.TP_STATUS_USER|status)
+		if err != nil {
+			log.Warningf("Failed to write packet ring block status: %v", err)
+		}
+	}
+	r.open = false
+	r.cur = (r.cur + 1) % r.req.BlockNr
+}
+
+// HandlePacket implements packet.ReceiveHandler.HandlePacket. It is analogous
+// to Linux's net/packet/af_packet.c:tpacket_rcv() for TPACKET_V3.
+func (r *packetRing) HandlePacket(pkt *packet.ReceivedPacket) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.released {
+		return false
+	}
+
+	var macOff, netOff uint32
+	if r.cooked {
+		macOff = linux.TPacketAlign(linux.TPACKET3_HDRLEN + 16)
+		netOff = macOff
+	} else {
+		macLen := uint32(pkt.LinkHeaderLen)
+		if macLen < 16 {
+			netOff = linux.TPacketAlign(linux.TPACKET3_HDRLEN + 16)
+		} else {
+			netOff = linux.TPacketAlign(linux.TPACKET3_HDRLEN + macLen)
+		}
+		macOff = netOff - macLen
+	}
+	snapLen := uint32(len(pkt.Data))
+	if maxFrameLen := r.req.BlockSize - r.firstPacketOffset(); macOff+snapLen > maxFrameLen {
+		if macOff >= maxFrameLen {
+			snapLen = 0
+		} else {
+			snapLen = maxFrameLen - macOff
+		}
+	}
+	frameLen := alignUp(macOff+snapLen, frameAlign)
+
+	notify := false
+	if r.open && r.hdr.BlkLen+frameLen > r.req.BlockSize {
+		r.retireBlockLocked(0)
+		notify = true
+	}
+	if !r.open && !r.openBlockLocked() {
+		// The application hasn't returned the next block; the queue is
+		// frozen until it does.
+		r.stats.Drops++
+		if notify {
+			r.stats.FreezeQCnt++
+		}
+		return notify
+	}
+
+	status := uint32(linux.TP_STATUS_USER)
+	if r.stats.Drops != 0 {
+		status |= linux.TP_STATUS_LOSING
+	}
+	sec, nsec := pkt.ReceivedAt.Unix(), pkt.ReceivedAt.Nanosecond()
+	hdr := linux.Tpacket3Hdr{
+		NextOffset: frameLen,
+		Sec:        uint32(sec),
+		Nsec:       uint32(nsec),
+		Snaplen:    snapLen,
+		Len:        uint32(len(pkt.Data)),
+		Status:     status,
+		Mac:        uint16(macOff),
+		Net:        uint16(netOff),
+	}
+	addr := linux.SockAddrLink{
+		Family:          linux.AF_PACKET,
+		Protocol:        socket.Htons(uint16(pkt.PacketInfo.Protocol)),
+		InterfaceIndex:  int32(pkt.SenderAddr.NIC),
+		PacketType:      toLinuxPacketType(pkt.PacketInfo.PktType),
+		HardwareAddrLen: byte(len(pkt.SenderAddr.Addr)),
+	}
+	copy(addr.HardwareAddr[:], pkt.SenderAddr.Addr)
+
+	buf := make([]byte, macOff+snapLen)
+	hdr.MarshalBytes(buf)
+	addr.MarshalBytes(buf[frameHeaderLen:])
+	copy(buf[macOff:], pkt.Data[:snapLen])
+	off := r.hdr.BlkLen
+	if err := r.writeAt(uint64(r.cur)*uint64(r.req.BlockSize)+uint64(off), buf); err != nil {
+		log.Warningf("Failed to write packet ring frame: %v", err)
+		r.stats.Drops++
+		return notify
+	}
+
+	if r.hdr.NumPkts == 0 {
+		r.hdr.TsFirstPktSec, r.hdr.TsFirstPktNsec = uint32(sec), uint32(nsec)
+	}
+	r.hdr.TsLastPktSec, r.hdr.TsLastPktNsec = uint32(sec), uint32(nsec)
+	r.hdr.NumPkts++
+	r.hdr.BlkLen += frameLen
+	r.lastPkt = off
+	r.stats.Packets++
+	return notify
+}
+
+// Readable implements packet.ReceiveHandler.Readable. As in Linux's
+// net/packet/af_packet.c:packet_poll(), the ring is readable if the block
+// preceding the current one is owned by the application.
+func (r *packetRing) Readable() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.released {
+		return false
+	}
+	status, err := r.blockStatus((r.cur + r.req.BlockNr - 1) % r.req.BlockNr)
+	return err == nil && status != linux.TP_STATUS_KERNEL
+}
+
+// NotifyTimer implements ktime.Listener.NotifyTimer. It retires the open
+// block if it holds any packets, as Linux's
+// net/packet/af_packet.c:prb_retire_rx_blk_timer_expired() does.
+func (r *packetRing) NotifyTimer(exp uint64, setting ktime.Setting) (ktime.Setting, bool) {
+	r.mu.Lock()
+	notify := false
+	if !r.released && r.open && r.hdr.NumPkts != 0 {
+		r.retireBlockLocked(linux.TP_STATUS_BLK_TMO)
+		r.openBlockLocked()
+		notify = true
+	}
+	r.mu.Unlock()
+	if notify {
+		r.queue.Notify(waiter.ReadableEvents)
+	}
+	return ktime.Setting{}, false
+}
+
+// takeStats returns and resets the ring's statistics.
+func (r *packetRing) takeStats() linux.TpacketStatsV3 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	r.stats = linux.TpacketStatsV3{}
+	return stats
+}
+
+// mapped returns true if the ring is mapped into any address space.
+func (r *packetRing) mapped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mappings != 0
+}
+
+// release tears down the ring. The ring must not be mapped.
+func (r *packetRing) release() {
+	r.timer.Destroy()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.released {
+		return
+	}
+	r.released = true
+	r.mfp.MemoryFile().DecRef(r.fr)
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (r *packetRing) AddMapping(_ context.Context, _ memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, _ bool) error {
+	// Linux's net/packet/af_packet.c:packet_mmap() requires that the whole
+	// ring be mapped at once.
+	if offset != 0 || uint64(ar.Length()) != r.size() {
+		return linuxerr.EINVAL
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.released {
+		return linuxerr.EINVAL
+	}
+	r.mappings++
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (r *packetRing) RemoveMapping(context.Context, memmap.MappingSpace, hostarch.AddrRange, uint64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mappings--
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (r *packetRing) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	return r.AddMapping(ctx, ms, dstAR, offset, writable)
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (r *packetRing) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	var err error
+	if required.End > r.size() {
+		err = &memmap.BusError{linuxerr.EFAULT}
+	}
+	if source := optional.Intersect(memmap.MappableRange{0, r.size()}); source.Length() != 0 {
+		return []memmap.Translation{
+			{
+				Source: source,
+				File:   r.mfp.MemoryFile(),
+				Offset: r.fr.Start + source.Start,
+				Perms:  hostarch.AnyAccess,
+			},
+		}, err
+	}
+	return nil, err
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (r *packetRing) InvalidateUnsavable(ctx context.Context) error {
+	return nil
+}
+
+// packetStats tracks the statistics reported by getsockopt(PACKET_STATISTICS)
+// for packet sockets without a receive ring.
+//
+// +stateify savable
+type packetStats struct {
+	// packets and drops are the endpoint's counters when the statistics
+	// were last read.
+	packets uint64
+	drops   uint64
+}
+
+// packetSockOpts is implemented by sockets that support SOL_PACKET options.
+type packetSockOpts interface {
+	getSockOptPacket(t *kernel.Task, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error)
+	setSockOptPacket(t *kernel.Task, name int, optVal []byte) *syserr.Error
+}
+
+// getSockOptPacket implements GetSockOpt when level is SOL_PACKET.
+func (s *socketOpsCommon) getSockOptPacket(t *kernel.Task, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	switch name {
+	case linux.PACKET_VERSION:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		s.packetMu.Lock()
+		defer s.packetMu.Unlock()
+		v := primitive.Int32(s.packetVersion)
+		return &v, nil
+
+	case linux.PACKET_HDRLEN:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var v primitive.Int32
+		if _, err := v.CopyIn(t, outPtr); err != nil {
+			return nil, syserr.FromError(err)
+		}
+		switch v {
+		case linux.TPACKET_V1:
+			v = linux.TPACKET_HDRLEN
+		case linux.TPACKET_V2:
+			v = linux.TPACKET2_HDRLEN
+		case linux.TPACKET_V3:
+			v = linux.TPACKET3_HDRLEN
+		default:
+			return nil, syserr.ErrInvalidArgument
+		}
+		return &v, nil
+
+	case linux.PACKET_STATISTICS:
+		s.packetMu.Lock()
+		defer s.packetMu.Unlock()
+		var stats linux.TpacketStatsV3
+		if s.rxRing != nil {
+			stats = s.rxRing.takeStats()
+		} else if es, ok := s.Endpoint.Stats().(*tcpip.TransportEndpointStats); ok {
+			packets := es.PacketsReceived.Value()
+			drops := es.ReceiveErrors.ReceiveBufferOverflow.Value()
+			stats.Packets = uint32(packets - s.packetStats.packets)
+			stats.Drops = uint32(drops - s.packetStats.drops)
+			s.packetStats = packetStats{packets: packets, drops: drops}
+		}
+		// As in Linux, tp_packets includes dropped packets.
+		stats.Packets += stats.Drops
+		if s.packetVersion == linux.TPACKET_V3 {
+			return &stats, nil
+		}
+		return &linux.TpacketStats{Packets: stats.Packets, Drops: stats.Drops}, nil
+	}
+
+	return nil, syserr.ErrProtocolNotAvailable
+}
+
+// setSockOptPacket implements SetSockOpt when level is SOL_PACKET.
+func (s *socketOpsCommon) setSockOptPacket(t *kernel.Task, name int, optVal []byte) *syserr.Error {
+	switch name {
+	case linux.PACKET_VERSION:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+		if v < linux.TPACKET_V1 || v > linux.TPACKET_V3 {
+			return syserr.ErrInvalidArgument
+		}
+		s.packetMu.Lock()
+		defer s.packetMu.Unlock()
+		if s.rxRing != nil {
+			return syserr.ErrBusy
+		}
+		s.packetVersion = v
+		return nil
+
+	case linux.PACKET_RX_RING:
+		s.packetMu.Lock()
+		defer s.packetMu.Unlock()
+		// Only TPACKET_V3 rings are supported. Returning ENOPROTOOPT lets
+		// applications fall back to reading packets from the socket.
+		if s.packetVersion != linux.TPACKET_V3 {
+			return syserr.ErrProtocolNotAvailable
+		}
+		var req linux.TpacketReq3
+		if len(optVal) < req.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		req.UnmarshalBytes(optVal)
+
+		// A request for no blocks tears down the existing ring.
+		if req.BlockNr == 0 {
+			if req.FrameNr != 0 {
+				return syserr.ErrInvalidArgument
+			}
+			return s.releaseRxRingLocked()
+		}
+		if err := validatePacketRingReq(&req); err != nil {
+			return err
+		}
+		if err := s.releaseRxRingLocked(); err != nil {
+			return err
+		}
+		hs, ok := s.Endpoint.(packet.ReceiveHandlerSetter)
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		r, err := newPacketRing(t, s.Queue, s.skType == linux.SOCK_DGRAM, req)
+		if err != nil {
+			return syserr.FromError(err)
+		}
+		s.rxRing = r
+		hs.SetReceiveHandler(r)
+		return nil
+
+	case linux.PACKET_TX_RING:
+		// Transmit rings aren't supported yet.
+		return syserr.ErrProtocolNotAvailable
+	}
+
+	// Other SOL_PACKET options aren't supported. Returning nil here would
+	// result in tcpdump thinking AF_PACKET features are supported and proceed
+	// to use them and break.
+	return syserr.ErrProtocolNotAvailable
+}
+
+// releaseRxRingLocked tears down the socket's receive ring, if any.
+//
+// +checklocks:s.packetMu
+func (s *socketOpsCommon) releaseRxRingLocked() *syserr.Error {
+	if s.rxRing == nil {
+		return nil
+	}
+	if s.rxRing.mapped() {
+		return syserr.ErrBusy
+	}
+	if hs, ok := s.Endpoint.(packet.ReceiveHandlerSetter); ok {
+		hs.SetReceiveHandler(nil)
+	}
+	s.rxRing.release()
+	s.rxRing = nil
+	return nil
+}
@@ -30,6 +30,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/sctp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
 	"gvisor.dev/gvisor/pkg/waiter"
@@ -46,24 +47,40 @@ type provider struct {
 var rawMissingLogger = log.BasicRateLimitedLogger(time.Minute)
 
 // getTransportProtocol figures out transport protocol. Currently only TCP,
-// UDP, and ICMP are supported. The bool return value is true when this socket
-// is associated with a transport protocol. This is only false for SOCK_RAW,
-// IPPROTO_IP sockets.
+// UDP, SCTP, and ICMP are supported. The bool return value is true when this
+// socket is associated with a transport protocol. This is only false for
+// SOCK_RAW, IPPROTO_IP sockets.
 func getTransportProtocol(ctx context.Context, stype linux.SockType, protocol int) (tcpip.TransportProtocolNumber, bool, *syserr.Error) {
 	switch stype {
 	case linux.SOCK_STREAM:
-		if protocol != 0 && protocol != unix.IPPROTO_TCP {
-			return 0, true, syserr.ErrInvalidArgument
+		switch protocol {
+		case 0, unix.IPPROTO_TCP:
+			return tcp.ProtocolNumber, true, nil
+		case unix.IPPROTO_SCTP:
+			// One-to-one style SCTP socket.
+			return sctp.ProtocolNumber, true, nil
+		}
+		return 0, true, syserr.ErrInvalidArgument
+
+	case linux.SOCK_SEQPACKET:
+		if protocol == unix.IPPROTO_SCTP {
+			// One-to-many style SCTP sockets are not supported.
+			return 0, true, syserr.ErrNotSupported
 		}
-		return tcp.ProtocolNumber, true, nil
 
 	case linux.SOCK_DGRAM:
 		switch protocol {
 		case 0, unix.IPPROTO_UDP:
 			return udp.ProtocolNumber, true, nil
 		case unix.IPPROTO_ICMP:
+			if err := checkPingGroup(ctx); err != nil {
+				return 0, true, err
+			}
 			return header.ICMPv4ProtocolNumber, true, nil
 		case unix.IPPROTO_ICMPV6:
+			if err := checkPingGroup(ctx); err != nil {
+				return 0, true, err
+			}
 			return header.ICMPv6ProtocolNumber, true, nil
 		}
 
@@ -94,6 +111,20 @@ func getTransportProtocol(ctx context.Context, stype linux.SockType, protocol in
 	return 0, true, syserr.ErrProtocolNotSupported
 }
 
+// checkPingGroup returns an error if the caller may not create ICMP echo
+// sockets in its network namespace, as determined by
+// /proc/sys/net/ipv4/ping_group_range.
+func checkPingGroup(ctx context.Context) *syserr.Error {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return nil
+	}
+	if netns := t.NetworkNamespace(); netns != nil && !netns.MayCreatePingSocket(t.Credentials()) {
+		return syserr.ErrPermissionDenied
+	}
+	return nil
+}
+
 // Socket creates a new socket object for the AF_INET, AF_INET6, or AF_PACKET
 // family.
 func (p *provider) Socket(t *kernel.Task, stype linux.SockType, protocol int) (*fs.File, *syserr.Error) {
@@ -16,11 +16,13 @@ package netstack
 
 import (
 	"fmt"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/syserr"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -78,16 +80,42 @@ func (s *Stack) Interfaces() map[int32]inet.Interface {
 
 // RemoveInterface implements inet.Stack.RemoveInterface.
 func (s *Stack) RemoveInterface(idx int32) error {
+	iface, ok := s.Interfaces()[idx]
 	nic := tcpip.NICID(idx)
-	return syserr.TranslateNetstackError(s.Stack.RemoveNIC(nic)).ToError()
+	if err := s.Stack.RemoveNIC(nic); err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	if ok {
+		inet.NotifyInterfaceRemoved(s, idx, iface)
+	}
+	return nil
+}
+
+// SetInterfaceUp implements inet.Stack.SetInterfaceUp.
+func (s *Stack) SetInterfaceUp(idx int32, up bool) error {
+	nic := tcpip.NICID(idx)
+	var err tcpip.Error
+	if up {
+		err = s.Stack.EnableNIC(nic)
+	} else {
+		err = s.Stack.DisableNIC(nic)
+	}
+	if err != nil {
+		return syserr.TranslateNetstackError(err).ToError()
+	}
+	if iface, ok := s.Interfaces()[idx]; ok {
+		inet.NotifyInterfaceChanged(s, idx, iface)
+	}
+	return nil
 }
 
 // InterfaceAddrs implements inet.Stack.InterfaceAddrs.
 func (s *Stack) InterfaceAddrs() map[int32][]inet.InterfaceAddr {
+	now := s.Stack.Clock().NowMonotonic()
 	nicAddrs := make(map[int32][]inet.InterfaceAddr)
-	for id, ni := range s.Stack.NICInfo() {
+	for id, infos := range s.Stack.PrimaryAddressInfo() {
 		var addrs []inet.InterfaceAddr
-		for _, a := range ni.ProtocolAddresses {
+		for _, a := range infos {
 			var family uint8
 			switch a.Protocol {
 			case ipv4.ProtocolNumber:
@@ -99,18 +127,55 @@ func (s *Stack) InterfaceAddrs() map[int32][]inet.InterfaceAddr {
 				continue
 			}
 
-			addrs = append(addrs, inet.InterfaceAddr{
+			addr := inet.InterfaceAddr{
 				Family:    family,
 				PrefixLen: uint8(a.AddressWithPrefix.PrefixLen),
+				Flags:     interfaceAddrFlags(a.ConfigType, a.Lifetimes, a.State),
 				Addr:      []byte(a.AddressWithPrefix.Address),
-				// TODO(b/68878065): Other fields.
-			})
+			}
+			if !a.Lifetimes.Deprecated {
+				addr.PreferredLifetime = remainingLifetime(now, a.Lifetimes.PreferredUntil)
+			}
+			addr.ValidLifetime = remainingLifetime(now, a.Lifetimes.ValidUntil)
+			addrs = append(addrs, addr)
 		}
 		nicAddrs[int32(id)] = addrs
 	}
 	return nicAddrs
 }
 
+// interfaceAddrFlags returns the IFA_F_* flags of an address with the given
+// properties.
+func interfaceAddrFlags(configType stack.AddressConfigType, lifetimes stack.AddressLifetimes, state stack.AddressAssignmentState) uint8 {
+	var flags uint8
+	if state == stack.AddressTentative {
+		flags |= linux.IFA_F_TENTATIVE
+	}
+	if lifetimes.Deprecated {
+		flags |= linux.IFA_F_DEPRECATED
+	}
+	// Like Linux, statically configured addresses that never expire are
+	// permanent.
+	if configType == stack.AddressConfigStatic && lifetimes.ValidUntil == (tcpip.MonotonicTime{}) {
+		flags |= linux.IFA_F_PERMANENT
+	}
+	return flags
+}
+
+// remainingLifetime returns the time left until the deadline until, or zero if
+// until is the zero value, i.e. the lifetime is infinite.
+func remainingLifetime(now, until tcpip.MonotonicTime) time.Duration {
+	if until == (tcpip.MonotonicTime{}) {
+		return 0
+	}
+	if d := until.Sub(now); d > 0 {
+		return d
+	}
+	// The lifetime has elapsed, but the address hasn't been updated yet.
+	// Don't report it as infinite.
+	return 1
+}
+
 // convertAddr converts an InterfaceAddr to a ProtocolAddress.
 func convertAddr(addr inet.InterfaceAddr) (tcpip.ProtocolAddress, error) {
 	var (
@@ -160,9 +225,32 @@ func (s *Stack) AddInterfaceAddr(idx int32, addr inet.InterfaceAddr) error {
 
 	// Attach address to interface.
 	nicID := tcpip.NICID(idx)
-	if err := s.Stack.AddProtocolAddress(nicID, protocolAddress, stack.AddressProperties{}); err != nil {
+	now := s.Stack.Clock().NowMonotonic()
+	var lifetimes stack.AddressLifetimes
+	lifetimes.Deprecated = addr.Flags&linux.IFA_F_DEPRECATED != 0
+	if !lifetimes.Deprecated && addr.PreferredLifetime != 0 {
+		lifetimes.PreferredUntil = now.Add(addr.PreferredLifetime)
+	}
+	if addr.ValidLifetime != 0 {
+		lifetimes.ValidUntil = now.Add(addr.ValidLifetime)
+	}
+	disp := &addressDispatcher{
+		stack: s,
+		nicID: nicID,
+		addr: inet.InterfaceAddr{
+			Family:    addr.Family,
+			PrefixLen: addr.PrefixLen,
+			Addr:      addr.Addr,
+		},
+	}
+	properties := stack.AddressProperties{
+		Lifetimes: lifetimes,
+		Disp:      disp,
+	}
+	if err := s.Stack.AddProtocolAddress(nicID, protocolAddress, properties); err != nil {
 		return syserr.TranslateNetstackError(err).ToError()
 	}
+	disp.scheduleExpiry(lifetimes, now)
 
 	// Add route for local network if it doesn't exist already.
 	localRoute := tcpip.Route{
@@ -209,6 +297,117 @@ func (s *Stack) RemoveInterfaceAddr(idx int32, addr inet.InterfaceAddr) error {
 	return nil
 }
 
+// addressDispatcher implements stack.AddressDispatcher for addresses added by
+// AddInterfaceAddr. Netstack treats address lifetimes as informational, so
+// addressDispatcher deprecates and removes the address when its lifetimes
+// expire, like Linux does. It also reports the removal of the address to
+// inet.NotifyInterfaceAddrRemoved.
+type addressDispatcher struct {
+	stack *Stack
+	nicID tcpip.NICID
+
+	// addr is the address, without flags or lifetimes. addr is immutable.
+	addr inet.InterfaceAddr
+
+	mu sync.Mutex
+
+	// lifetimes and state are the most recent properties of the address
+	// reported by netstack.
+	//
+	// +checklocks:mu
+	lifetimes stack.AddressLifetimes
+	// +checklocks:mu
+	state stack.AddressAssignmentState
+
+	// removed is set once the address has been removed.
+	//
+	// +checklocks:mu
+	removed bool
+
+	// deprecateTimer and invalidateTimer fire when the address' preferred
+	// and valid lifetimes expire, respectively. They are nil if the
+	// corresponding lifetime is infinite.
+	//
+	// +checklocks:mu
+	deprecateTimer tcpip.Timer
+	// +checklocks:mu
+	invalidateTimer tcpip.Timer
+}
+
+// OnChanged implements stack.AddressDispatcher.OnChanged.
+func (d *addressDispatcher) OnChanged(lifetimes stack.AddressLifetimes, state stack.AddressAssignmentState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lifetimes = lifetimes
+	d.state = state
+}
+
+// OnRemoved implements stack.AddressDispatcher.OnRemoved.
+func (d *addressDispatcher) OnRemoved(reason stack.AddressRemovalReason) {
+	d.mu.Lock()
+	d.removed = true
+	if d.deprecateTimer != nil {
+		d.deprecateTimer.Stop()
+	}
+	if d.invalidateTimer != nil {
+		d.invalidateTimer.Stop()
+	}
+	addr := d.addr
+	addr.Flags = interfaceAddrFlags(stack.AddressConfigStatic, d.lifetimes, d.state)
+	d.mu.Unlock()
+
+	if reason == stack.AddressRemovalDADFailed {
+		addr.Flags |= linux.IFA_F_DADFAILED
+	}
+	inet.NotifyInterfaceAddrRemoved(d.stack, int32(d.nicID), addr)
+}
+
+// scheduleExpiry arms timers for the finite lifetimes in lifetimes, which were
+// computed at time now.
+func (d *addressDispatcher) scheduleExpiry(lifetimes stack.AddressLifetimes, now tcpip.MonotonicTime) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.removed {
+		return
+	}
+	clock := d.stack.Stack.Clock()
+	if !lifetimes.Deprecated && lifetimes.PreferredUntil != (tcpip.MonotonicTime{}) {
+		d.deprecateTimer = clock.AfterFunc(lifetimes.PreferredUntil.Sub(now), d.deprecate)
+	}
+	if lifetimes.ValidUntil != (tcpip.MonotonicTime{}) {
+		d.invalidateTimer = clock.AfterFunc(lifetimes.ValidUntil.Sub(now), d.invalidate)
+	}
+}
+
+// deprecate is called when the address' preferred lifetime expires.
+func (d *addressDispatcher) deprecate() {
+	d.mu.Lock()
+	removed := d.removed
+	lifetimes := stack.AddressLifetimes{
+		Deprecated: true,
+		ValidUntil: d.lifetimes.ValidUntil,
+	}
+	d.mu.Unlock()
+	if removed {
+		return
+	}
+	// The address may have been removed concurrently, so errors are expected.
+	_ = d.stack.Stack.SetAddressLifetimes(d.nicID, tcpip.Address(d.addr.Addr), lifetimes)
+}
+
+// invalidate is called when the address' valid lifetime expires.
+func (d *addressDispatcher) invalidate() {
+	d.mu.Lock()
+	removed := d.removed
+	d.mu.Unlock()
+	if removed {
+		return
+	}
+	// As above, the address may have been removed concurrently. Removal
+	// calls OnRemoved, which reports the expiry.
+	_ = d.stack.RemoveInterfaceAddr(int32(d.nicID), d.addr)
+}
+
 // TCPReceiveBufferSize implements inet.Stack.TCPReceiveBufferSize.
 func (s *Stack) TCPReceiveBufferSize() (inet.TCPBufferSize, error) {
 	var rs tcpip.TCPReceiveBufferSizeRangeOption
@@ -279,6 +478,21 @@ func (s *Stack) SetTCPRecovery(recovery inet.TCPLossRecovery) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
 }
 
+// TCPRetries2 implements inet.Stack.TCPRetries2.
+func (s *Stack) TCPRetries2() (uint32, error) {
+	var retries tcpip.TCPMaxRetriesOption
+	if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &retries); err != nil {
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+	return uint32(retries), nil
+}
+
+// SetTCPRetries2 implements inet.Stack.SetTCPRetries2.
+func (s *Stack) SetTCPRetries2(retries uint32) error {
+	opt := tcpip.TCPMaxRetriesOption(retries)
+	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
+}
+
 // Statistics implements inet.Stack.Statistics.
 func (s *Stack) Statistics(stat interface{}, arg string) error {
 	switch stats := stat.(type) {
@@ -288,21 +502,22 @@ func (s *Stack) Statistics(stat interface{}, arg string) error {
 				continue
 			}
 			// TODO(gvisor.dev/issue/2103) Support stubbed stats.
+			txDropped := ni.Stats.TxPacketsDroppedNoBufferSpace.Value()
 			*stats = inet.StatDev{
 				// Receive section.
-				ni.Stats.Rx.Bytes.Value(),   // bytes.
-				ni.Stats.Rx.Packets.Value(), // packets.
-				0,                           // errs.
-				0,                           // drop.
-				0,                           // fifo.
-				0,                           // frame.
-				0,                           // compressed.
-				0,                           // multicast.
+				ni.Stats.Rx.Bytes.Value(),               // bytes.
+				ni.Stats.Rx.Packets.Value(),             // packets.
+				ni.Stats.MalformedL4RcvdPackets.Value(), // errs.
+				ni.Stats.DisabledRx.Packets.Value(),     // drop.
+				0,                                       // fifo.
+				0,                                       // frame.
+				0,                                       // compressed.
+				0,                                       // multicast.
 				// Transmit section.
 				ni.Stats.Tx.Bytes.Value(),   // bytes.
 				ni.Stats.Tx.Packets.Value(), // packets.
 				0,                           // errs.
-				0,                           // drop.
+				txDropped,                   // drop.
 				0,                           // fifo.
 				0,                           // colls.
 				0,                           // carrier.
@@ -438,12 +653,159 @@ func (s *Stack) RouteTable() []inet.Route {
 			DstAddr:         []byte(rt.Destination.ID()),
 			OutputInterface: int32(rt.NIC),
 			GatewayAddr:     []byte(rt.Gateway),
+			Priority:        rt.Metric,
 		})
 	}
 
 	return routeTable
 }
 
+// convertRoute converts an inet.Route to a tcpip.Route. The NIC of the
+// returned route is 0 if route has no output interface.
+func convertRoute(route inet.Route) (tcpip.Route, error) {
+	var addrSize int
+	switch route.Family {
+	case linux.AF_INET:
+		addrSize = header.IPv4AddressSize
+	case linux.AF_INET6:
+		addrSize = header.IPv6AddressSize
+	default:
+		return tcpip.Route{}, linuxerr.ENOTSUP
+	}
+	if int(route.DstLen) > addrSize*8 {
+		return tcpip.Route{}, linuxerr.EINVAL
+	}
+	dst := route.DstAddr
+	if len(dst) == 0 {
+		// Routes without RTA_DST, e.g. default routes, match any destination.
+		dst = make([]byte, addrSize)
+	}
+	if len(dst) != addrSize || (len(route.GatewayAddr) != 0 && len(route.GatewayAddr) != addrSize) {
+		return tcpip.Route{}, linuxerr.EINVAL
+	}
+	return tcpip.Route{
+		Destination: tcpip.AddressWithPrefix{
+			Address:   tcpip.Address(dst),
+			PrefixLen: int(route.DstLen),
+		}.Subnet(),
+		Gateway: tcpip.Address(route.GatewayAddr),
+		NIC:     tcpip.NICID(route.OutputInterface),
+		Metric:  route.Priority,
+	}, nil
+}
+
+// AddRoute implements inet.Stack.AddRoute.
+func (s *Stack) AddRoute(route inet.Route, flags uint16) error {
+	rt, err := convertRoute(route)
+	if err != nil {
+		return err
+	}
+	if rt.NIC != 0 && !s.Stack.HasNIC(rt.NIC) {
+		return linuxerr.ENODEV
+	}
+
+	s.Stack.UpdateRouteTable(func(table []tcpip.Route) ([]tcpip.Route, bool) {
+		if rt.NIC == 0 {
+			// Like Linux, use the interface of the directly connected network
+			// that contains the gateway.
+			if len(rt.Gateway) == 0 {
+				err = linuxerr.ENODEV
+				return nil, false
+			}
+			for _, r := range table {
+				if len(r.Gateway) == 0 && r.Destination.Contains(rt.Gateway) {
+					rt.NIC = r.NIC
+					break
+				}
+			}
+			if rt.NIC == 0 {
+				err = linuxerr.ENETUNREACH
+				return nil, false
+			}
+		}
+		table, err = insertRoute(table, rt, flags)
+		return table, err == nil
+	})
+	return err
+}
+
+// insertRoute returns table with rt added according to the NLM_F_* flags of an
+// RTM_NEWROUTE request.
+//
+// Since the route table is searched in order, the table is kept ordered by
+// decreasing prefix length and then increasing metric, which corresponds to
+// Linux's route selection. Like Linux, IPv4 routes are added before existing
+// routes with the same destination and metric unless NLM_F_APPEND is set,
+// while IPv6 routes are always added after them. See
+// net/ipv4/fib_trie.c:fib_table_insert() and
+// net/ipv6/ip6_fib.c:fib6_add_rt2node().
+func insertRoute(table []tcpip.Route, rt tcpip.Route, flags uint16) ([]tcpip.Route, error) {
+	for i, r := range table {
+		if r.Destination != rt.Destination || r.Metric != rt.Metric {
+			continue
+		}
+		if flags&linux.NLM_F_EXCL != 0 {
+			return nil, linuxerr.EEXIST
+		}
+		if flags&linux.NLM_F_REPLACE != 0 {
+			table[i] = rt
+			return table, nil
+		}
+		if r == rt {
+			return nil, linuxerr.EEXIST
+		}
+	}
+	if flags&linux.NLM_F_CREATE == 0 {
+		return nil, linuxerr.ENOENT
+	}
+
+	appendToGroup := flags&linux.NLM_F_APPEND != 0 || len(rt.Destination.ID()) == header.IPv6AddressSize
+	prefix := rt.Destination.Prefix()
+	pos := len(table)
+	for i, r := range table {
+		if len(r.Destination.ID()) != len(rt.Destination.ID()) {
+			continue
+		}
+		rPrefix := r.Destination.Prefix()
+		if rPrefix < prefix || (rPrefix == prefix && r.Metric > rt.Metric) ||
+			(rPrefix == prefix && r.Metric == rt.Metric && r.Destination == rt.Destination && !appendToGroup) {
+			pos = i
+			break
+		}
+	}
+	table = append(table, tcpip.Route{})
+	copy(table[pos+1:], table[pos:])
+	table[pos] = rt
+	return table, nil
+}
+
+// RemoveRoute implements inet.Stack.RemoveRoute.
+func (s *Stack) RemoveRoute(route inet.Route) error {
+	rt, err := convertRoute(route)
+	if err != nil {
+		return err
+	}
+
+	err = linuxerr.ESRCH
+	s.Stack.UpdateRouteTable(func(table []tcpip.Route) ([]tcpip.Route, bool) {
+		for i, r := range table {
+			if r.Destination != rt.Destination {
+				continue
+			}
+			// Like Linux, unspecified attributes match any route.
+			if (rt.NIC != 0 && r.NIC != rt.NIC) ||
+				(len(rt.Gateway) != 0 && r.Gateway != rt.Gateway) ||
+				(rt.Metric != 0 && r.Metric != rt.Metric) {
+				continue
+			}
+			err = nil
+			return append(table[:i], table[i+1:]...), true
+		}
+		return nil, false
+	})
+	return err
+}
+
 // IPTables returns the stack's iptables.
 func (s *Stack) IPTables() (*stack.IPTables, error) {
 	return s.Stack.IPTables(), nil
@@ -491,3 +853,30 @@ func (s *Stack) PortRange() (uint16, uint16) {
 func (s *Stack) SetPortRange(start uint16, end uint16) error {
 	return syserr.TranslateNetstackError(s.Stack.SetPortRange(start, end)).ToError()
 }
+
+// ConnTrackTimeouts implements inet.Stack.ConnTrackTimeouts.
+func (s *Stack) ConnTrackTimeouts() (stack.ConnTrackTimeouts, error) {
+	return s.Stack.IPTables().ConnTrack().Timeouts(), nil
+}
+
+// SetConnTrackTimeouts implements inet.Stack.SetConnTrackTimeouts.
+func (s *Stack) SetConnTrackTimeouts(timeouts stack.ConnTrackTimeouts) error {
+	s.Stack.IPTables().ConnTrack().SetTimeouts(timeouts)
+	return nil
+}
+
+// ConnTrackMax implements inet.Stack.ConnTrackMax.
+func (s *Stack) ConnTrackMax() (int, error) {
+	return s.Stack.IPTables().ConnTrack().Max(), nil
+}
+
+// SetConnTrackMax implements inet.Stack.SetConnTrackMax.
+func (s *Stack) SetConnTrackMax(max int) error {
+	s.Stack.IPTables().ConnTrack().SetMax(max)
+	return nil
+}
+
+// ConnTrackCount implements inet.Stack.ConnTrackCount.
+func (s *Stack) ConnTrackCount() (int, error) {
+	return s.Stack.IPTables().ConnTrack().Count(), nil
+}
@@ -79,6 +79,10 @@ func errOriginToLinux(origin tcpip.SockErrOrigin) uint8 {
 		return linux.SO_EE_ORIGIN_ICMP
 	case tcpip.SockExtErrorOriginICMP6:
 		return linux.SO_EE_ORIGIN_ICMP6
+	case tcpip.SockExtErrorOriginZeroCopy:
+		return linux.SO_EE_ORIGIN_ZEROCOPY
+	case tcpip.SockExtErrorOriginTimestamping:
+		return linux.SO_EE_ORIGIN_TIMESTAMPING
 	default:
 		panic(fmt.Sprintf("unknown socket origin: %d", origin))
 	}
@@ -92,12 +96,23 @@ func sockErrCmsgToLinux(sockErr *tcpip.SockError) linux.SockErrCMsg {
 	}
 
 	ee := linux.SockExtendedErr{
-		Errno:  uint32(syserr.TranslateNetstackError(sockErr.Err).ToLinux()),
 		Origin: errOriginToLinux(sockErr.Cause.Origin()),
 		Type:   sockErr.Cause.Type(),
 		Code:   sockErr.Cause.Code(),
 		Info:   sockErr.Cause.Info(),
 	}
+	if sockErr.Err != nil {
+		ee.Errno = uint32(syserr.TranslateNetstackError(sockErr.Err).ToLinux())
+	}
+	// MSG_ZEROCOPY notifications cover a range of notification IDs.
+	if zc, ok := sockErr.Cause.(*tcpip.ZeroCopySockError); ok {
+		ee.Data = zc.Hi
+	}
+	// Transmit timestamps carry ENOMSG and the timestamp key.
+	if ts, ok := sockErr.Cause.(*tcpip.TimestampingSockError); ok {
+		ee.Errno = uint32(unix.ENOMSG)
+		ee.Data = ts.Key
+	}
 
 	switch sockErr.NetProto {
 	case header.IPv4ProtocolNumber:
@@ -142,6 +157,8 @@ func NewIPControlMessages(family int, cmgs tcpip.ReceivableControlMessages) IPCo
 		HasIPPacketInfo:    cmgs.HasIPPacketInfo,
 		PacketInfo:         packetInfoToLinux(cmgs.PacketInfo),
 		HasIPv6PacketInfo:  cmgs.HasIPv6PacketInfo,
+		HasGROSize:         cmgs.HasGROSize,
+		GROSize:            cmgs.GROSize,
 		OriginalDstAddress: orgDstAddr,
 		SockErr:            sockErrCmsgToLinux(cmgs.SockErr),
 	}
@@ -150,9 +167,32 @@ func NewIPControlMessages(family int, cmgs tcpip.ReceivableControlMessages) IPCo
 		cm.IPv6PacketInfo = ipv6PacketInfoToLinux(cmgs.IPv6PacketInfo)
 	}
 
+	if cmgs.HasSCTPSndRcvInfo {
+		cm.HasSCTPSndRcvInfo = true
+		cm.SCTPSndRcvInfo = sctpSndRcvInfoToLinux(cmgs.SCTPSndRcvInfo)
+	}
+
 	return cm
 }
 
+// sctpSndRcvInfoToLinux converts received SCTP message information to Linux
+// format. The payload protocol identifier is opaque to the kernel, which
+// passes it to the application in network byte order.
+func sctpSndRcvInfoToLinux(info tcpip.SCTPSndRcvInfo) linux.SCTPSndRcvInfo {
+	var flags uint16
+	if info.Unordered {
+		flags |= linux.SCTP_UNORDERED
+	}
+	return linux.SCTPSndRcvInfo{
+		Stream: info.Stream,
+		SSN:    info.SSN,
+		Flags:  flags,
+		PPID:   Htonl(info.PPID),
+		TSN:    info.TSN,
+		CumTSN: info.CumTSN,
+	}
+}
+
 // IPControlMessages contains socket control messages for IP sockets.
 // This can contain Linux specific structures unlike tcpip.ControlMessages.
 //
@@ -165,6 +205,10 @@ type IPControlMessages struct {
 	// was received.
 	Timestamp time.Time `state:".(int64)"`
 
+	// HasTimestamping indicates whether Timestamp should be reported as an
+	// SCM_TIMESTAMPING control message.
+	HasTimestamping bool
+
 	// HasInq indicates whether Inq is valid/set.
 	HasInq bool
 
@@ -207,6 +251,27 @@ type IPControlMessages struct {
 	// PacketInfo holds interface and address data on an incoming packet.
 	IPv6PacketInfo linux.ControlMessageIPv6PacketInfo
 
+	// HasGSOSize indicates whether GSOSize is valid/set.
+	HasGSOSize bool
+
+	// GSOSize is the size of the UDP datagrams that an outgoing payload is
+	// segmented into, as set by a UDP_SEGMENT control message.
+	GSOSize uint16
+
+	// HasGROSize indicates whether GROSize is valid/set.
+	HasGROSize bool
+
+	// GROSize is the size of the UDP datagrams that were coalesced into an
+	// incoming payload.
+	GROSize uint16
+
+	// HasSCTPSndRcvInfo indicates whether SCTPSndRcvInfo is valid/set.
+	HasSCTPSndRcvInfo bool
+
+	// SCTPSndRcvInfo describes an SCTP user message, as carried by an
+	// SCTP_SNDRCV control message.
+	SCTPSndRcvInfo linux.SCTPSndRcvInfo
+
 	// OriginalDestinationAddress holds the original destination address
 	// and port of the incoming packet.
 	OriginalDstAddress linux.SockAddr
@@ -536,6 +601,10 @@ func UnmarshalSockAddr(family int, data []byte) linux.SockAddr {
 		var addr linux.SockAddrNetlink
 		addr.UnmarshalUnsafe(data)
 		return &addr
+	case unix.AF_VSOCK:
+		var addr linux.SockAddrVM
+		addr.UnmarshalUnsafe(data)
+		return &addr
 	default:
 		panic(fmt.Sprintf("Unsupported socket family %v", family))
 	}
@@ -557,6 +626,18 @@ func Htons(v uint16) uint16 {
 	return Ntohs(v)
 }
 
+// Ntohl converts a 32-bit number from network byte order to host byte order. It
+// assumes that the host is little endian.
+func Ntohl(v uint32) uint32 {
+	return v<<24 | (v<<8)&0xff0000 | (v>>8)&0xff00 | v>>24
+}
+
+// Htonl converts a 32-bit number from host byte order to network byte order. It
+// assumes that the host is little endian.
+func Htonl(v uint32) uint32 {
+	return Ntohl(v)
+}
+
 // isLinkLocal determines if the given IPv6 address is link-local. This is the
 // case when it has the fe80::/10 prefix. This check is used to determine when
 // the NICID is relevant for a given IPv6 address.
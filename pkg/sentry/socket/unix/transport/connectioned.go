@@ -52,6 +52,9 @@ type ConnectingEndpoint interface {
 	// GetLocalAddress returns the bound path.
 	GetLocalAddress() (tcpip.FullAddress, tcpip.Error)
 
+	// Credentials implements ConnectedEndpoint.Credentials.
+	Credentials() CredentialsControlMessage
+
 	// Locker protects the following methods. While locked, only the holder of
 	// the lock can change the return value of the protected methods.
 	locker
@@ -132,7 +135,7 @@ func NewConnectioned(ctx context.Context, stype linux.SockType, uid uniqueid.Pro
 
 func newConnectioned(ctx context.Context, stype linux.SockType, uid uniqueid.Provider) *connectionedEndpoint {
 	ep := &connectionedEndpoint{
-		baseEndpoint: baseEndpoint{Queue: &waiter.Queue{}},
+		baseEndpoint: baseEndpoint{Queue: &waiter.Queue{}, peekOffset: -1},
 		id:           uid.UniqueID(),
 		idGenerator:  uid,
 		stype:        stype,
@@ -180,7 +183,7 @@ func NewPair(ctx context.Context, stype linux.SockType, uid uniqueid.Provider) (
 // socketpair.
 func NewExternal(stype linux.SockType, uid uniqueid.Provider, queue *waiter.Queue, receiver Receiver, connected ConnectedEndpoint) Endpoint {
 	ep := &connectionedEndpoint{
-		baseEndpoint: baseEndpoint{Queue: queue, receiver: receiver, connected: connected},
+		baseEndpoint: baseEndpoint{Queue: queue, receiver: receiver, connected: connected, peekOffset: -1},
 		id:           uid.UniqueID(),
 		idGenerator:  uid,
 		stype:        stype,
@@ -313,11 +316,14 @@ func (e *connectionedEndpoint) BidirectionalConnect(ctx context.Context, ce Conn
 		return syserr.ErrConnectionRefused
 	}
 
-	// Create a newly bound connectionedEndpoint.
+	// Create a newly bound connectionedEndpoint. Like in Linux, it reports
+	// the credentials of the listening socket to its peer.
 	ne := &connectionedEndpoint{
 		baseEndpoint: baseEndpoint{
-			path:  e.path,
-			Queue: &waiter.Queue{},
+			path:       e.path,
+			Queue:      &waiter.Queue{},
+			creds:      e.creds,
+			peekOffset: -1,
 		},
 		id:          e.idGenerator.UniqueID(),
 		idGenerator: e.idGenerator,
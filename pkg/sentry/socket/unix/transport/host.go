@@ -31,6 +31,15 @@ import (
 	"gvisor.dev/gvisor/pkg/waiter"
 )
 
+// hostCreds is the host identity of the sandbox, which is sent in place of the
+// credentials of sandboxed processes on host sockets. It is computed at startup
+// since the sentry can't call getuid(2) and getgid(2) once sandboxed.
+var hostCreds = unix.Ucred{
+	Pid: int32(unix.Getpid()),
+	Uid: uint32(unix.Getuid()),
+	Gid: uint32(unix.Getgid()),
+}
+
 // SCMRights implements RightsControlMessage with host FDs.
 type SCMRights struct {
 	FDs []int
@@ -153,15 +162,33 @@ func (c *HostConnectedEndpoint) Send(ctx context.Context, data [][]byte, control
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if !controlMessages.Empty() {
-		return 0, false, syserr.ErrInvalidEndpointState
+	// Only files backed by host FDs, such as host eventfds, can be passed to
+	// the host.
+	var control []byte
+	if controlMessages.Rights != nil {
+		rights, ok := controlMessages.Rights.(HostRightsControlMessage)
+		if !ok {
+			return 0, false, syserr.ErrInvalidEndpointState
+		}
+		fds, ok := rights.HostFDs()
+		if !ok {
+			return 0, false, syserr.ErrInvalidEndpointState
+		}
+		control = unix.UnixRights(fds...)
+	}
+
+	// The host kernel validates SCM_CREDENTIALS against the identity of the
+	// sender, so credentials sent by the application are replaced with the
+	// sandbox's host identity.
+	if controlMessages.Credentials != nil {
+		control = append(control, unix.UnixCredentials(&hostCreds)...)
 	}
 
 	// Since stream sockets don't preserve message boundaries, we can write
 	// only as much of the message as fits in the send buffer.
 	truncate := c.stype == linux.SOCK_STREAM
 
-	n, totalLen, err := fdWriteVec(c.fd, data, c.SendMaxQueueSize(), truncate)
+	n, totalLen, err := fdWriteVec(c.fd, data, control, c.SendMaxQueueSize(), truncate)
 	if n < totalLen && err == nil {
 		// The host only returns a short write if it would otherwise
 		// block (and only for stream sockets).
@@ -174,6 +201,12 @@ func (c *HostConnectedEndpoint) Send(ctx context.Context, data [][]byte, control
 		err = nil
 	}
 
+	// The host kernel has duplicated the passed FDs, so the files are no
+	// longer needed once any data has been sent.
+	if n > 0 && controlMessages.Rights != nil {
+		controlMessages.Rights.Release(ctx)
+	}
+
 	// There is no need for the callee to call SendNotify because fdWriteVec
 	// uses the host's sendmsg(2) and the host kernel's queue.
 	return n, false, syserr.FromError(err)
@@ -205,6 +238,12 @@ func (c *HostConnectedEndpoint) Writable() bool {
 	return fdnotifier.NonBlockingPoll(int32(c.fd), waiter.WritableEvents)&waiter.WritableEvents != 0
 }
 
+// Credentials implements ConnectedEndpoint.Credentials.
+func (c *HostConnectedEndpoint) Credentials() CredentialsControlMessage {
+	// Host peers have no identity in the sandbox.
+	return nil
+}
+
 // Passcred implements ConnectedEndpoint.Passcred.
 func (c *HostConnectedEndpoint) Passcred() bool {
 	// We don't support credential passing for host sockets.
@@ -229,7 +268,7 @@ func (c *HostConnectedEndpoint) EventUpdate() error {
 }
 
 // Recv implements Receiver.Recv.
-func (c *HostConnectedEndpoint) Recv(ctx context.Context, data [][]byte, creds bool, numRights int, peek bool) (int64, int64, ControlMessages, bool, tcpip.FullAddress, bool, *syserr.Error) {
+func (c *HostConnectedEndpoint) Recv(ctx context.Context, data [][]byte, creds bool, numRights int, peek bool, skip int64) (int64, int64, ControlMessages, bool, tcpip.FullAddress, bool, *syserr.Error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -238,9 +277,22 @@ func (c *HostConnectedEndpoint) Recv(ctx context.Context, data [][]byte, creds b
 		cm.EnableFDs(int(numRights))
 	}
 
+	// The host can't peek at an offset, so skipped data is peeked into a
+	// scratch buffer and discarded. Unlike in Linux, this can't skip past
+	// the first message of packet sockets.
+	maxlen := c.RecvMaxQueueSize()
+	if peek && skip > 0 {
+		if skip >= maxlen {
+			return 0, 0, ControlMessages{}, false, tcpip.FullAddress{}, false, syserr.ErrWouldBlock
+		}
+		data = append([][]byte{make([]byte, skip)}, data...)
+	} else {
+		skip = 0
+	}
+
 	// N.B. Unix sockets don't have a receive buffer, the send buffer
 	// serves both purposes.
-	rl, ml, cl, cTrunc, err := fdReadVec(c.fd, data, []byte(cm), peek, c.RecvMaxQueueSize())
+	rl, ml, cl, cTrunc, err := fdReadVec(c.fd, data, []byte(cm), peek, maxlen)
 	if rl > 0 && err != nil {
 		// We got some data, so all we need to do on error is return
 		// the data that we got. Short reads are fine, no need to
@@ -250,6 +302,14 @@ func (c *HostConnectedEndpoint) Recv(ctx context.Context, data [][]byte, creds b
 	if err != nil {
 		return 0, 0, ControlMessages{}, false, tcpip.FullAddress{}, false, syserr.FromError(err)
 	}
+	if skip > 0 && rl > 0 {
+		if rl <= skip {
+			// There's no data past the offset.
+			return 0, 0, ControlMessages{}, false, tcpip.FullAddress{}, false, syserr.ErrWouldBlock
+		}
+		rl -= skip
+		ml -= skip
+	}
 
 	// There is no need for the callee to call RecvNotify because fdReadVec uses
 	// the host's recvmsg(2) and the host kernel's queue.
@@ -0,0 +1,117 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// HostAbstractEndpoint is a BoundEndpoint for a socket bound to a name in the
+// abstract socket namespace of the host (more precisely, of the network
+// namespace that the sentry runs in). Connecting to it connects a new host
+// socket to the host endpoint bound to the same name.
+//
+// +stateify savable
+type HostAbstractEndpoint struct {
+	// name is the abstract socket name, without the leading NUL byte.
+	name string
+}
+
+// NewHostAbstractEndpoint returns a BoundEndpoint that connects to the
+// abstract socket name in the host's network namespace.
+func NewHostAbstractEndpoint(name string) *HostAbstractEndpoint {
+	return &HostAbstractEndpoint{name: name}
+}
+
+// BidirectionalConnect implements BoundEndpoint.BidirectionalConnect.
+func (e *HostAbstractEndpoint) BidirectionalConnect(ctx context.Context, ce ConnectingEndpoint, returnConnect func(Receiver, ConnectedEndpoint)) *syserr.Error {
+	// No lock ordering required as only the ConnectingEndpoint has a mutex.
+	ce.Lock()
+
+	// Check connecting state.
+	if ce.Connected() {
+		ce.Unlock()
+		return syserr.ErrAlreadyConnected
+	}
+	if ce.ListeningLocked() {
+		ce.Unlock()
+		return syserr.ErrInvalidEndpointState
+	}
+
+	c, err := e.newConnectedEndpoint(ce.Type(), ce.WaiterQueue())
+	if err != nil {
+		ce.Unlock()
+		return err
+	}
+
+	returnConnect(c, c)
+	ce.Unlock()
+	if err := c.Init(); err != nil {
+		return syserr.FromError(err)
+	}
+
+	return nil
+}
+
+// UnidirectionalConnect implements BoundEndpoint.UnidirectionalConnect.
+func (e *HostAbstractEndpoint) UnidirectionalConnect(ctx context.Context) (ConnectedEndpoint, *syserr.Error) {
+	c, err := e.newConnectedEndpoint(linux.SOCK_DGRAM, &waiter.Queue{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Init(); err != nil {
+		return nil, syserr.FromError(err)
+	}
+
+	// We don't need the receiver.
+	c.CloseRecv()
+	c.Release(ctx)
+
+	return c, nil
+}
+
+func (e *HostAbstractEndpoint) newConnectedEndpoint(sockType linux.SockType, queue *waiter.Queue) (*SCMConnectedEndpoint, *syserr.Error) {
+	fd, err := unix.Socket(unix.AF_UNIX, int(sockType)|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, syserr.FromError(err)
+	}
+	// Go maps a leading '@' to the NUL byte of an abstract address.
+	if err := unix.Connect(fd, &unix.SockaddrUnix{Name: "@" + e.name}); err != nil {
+		unix.Close(fd)
+		return nil, syserr.ErrConnectionRefused
+	}
+
+	c, serr := NewSCMEndpoint(fd, queue, "\x00"+e.name)
+	if serr != nil {
+		unix.Close(fd)
+		log.Warningf("Invalid host socket for abstract address %q: %v", e.name, serr)
+		return nil, serr
+	}
+	return c, nil
+}
+
+// Release implements BoundEndpoint.Release.
+func (*HostAbstractEndpoint) Release(context.Context) {}
+
+// Passcred implements BoundEndpoint.Passcred.
+func (*HostAbstractEndpoint) Passcred() bool {
+	return false
+}
@@ -209,22 +209,29 @@ func (q *queue) Dequeue() (e *message, notify bool, err *syserr.Error) {
 	return e, notify, nil
 }
 
-// Peek returns the first entry in the data queue, if one exists.
-func (q *queue) Peek() (*message, *syserr.Error) {
+// PeekAt returns a copy of the first message in the queue whose data extends
+// past the first skip bytes of queued data, if one exists, and the offset of
+// the first byte past them in that message.
+func (q *queue) PeekAt(skip int64) (*message, int64, *syserr.Error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	if q.dataList.Front() == nil {
+	m := q.dataList.Front()
+	for m != nil && skip > 0 && skip >= m.Length() {
+		skip -= m.Length()
+		m = m.Next()
+	}
+	if m == nil {
 		err := syserr.ErrWouldBlock
 		if q.closed {
 			if err = syserr.ErrClosedForReceive; q.unread {
 				err = syserr.ErrConnectionReset
 			}
 		}
-		return nil, err
+		return nil, 0, err
 	}
 
-	return q.dataList.Front().Peek(), nil
+	return m.Peek(), skip, nil
 }
 
 // QueuedSize returns the number of bytes currently in the queue, that is, the
@@ -46,6 +46,17 @@ type RightsControlMessage interface {
 	Release(ctx context.Context)
 }
 
+// A HostRightsControlMessage is a RightsControlMessage whose files may be
+// passed to host peers.
+type HostRightsControlMessage interface {
+	RightsControlMessage
+
+	// HostFDs returns the host FDs backing the files in the message. The FDs
+	// remain owned by the files. ok is false if any file can't be passed to
+	// the host.
+	HostFDs() (fds []int, ok bool)
+}
+
 // A CredentialsControlMessage is a control message containing Unix credentials.
 type CredentialsControlMessage interface {
 	// Equals returns true iff the two messages are equal.
@@ -207,6 +218,16 @@ type Endpoint interface {
 	// SocketOptions returns the structure which contains all the socket
 	// level options.
 	SocketOptions() *tcpip.SocketOptions
+
+	// SetCredentials sets the credentials reported to the endpoint's peers
+	// by SO_PEERCRED. It should be called before connecting, listening or
+	// after creating a socket pair.
+	SetCredentials(creds CredentialsControlMessage)
+
+	// PeerCredentials returns the credentials of the connected endpoint, as
+	// reported by SO_PEERCRED. It returns nil if the endpoint isn't
+	// connected or the credentials of its peer are unknown.
+	PeerCredentials() CredentialsControlMessage
 }
 
 // A Credentialer is a socket or endpoint that supports the SO_PASSCRED socket
@@ -343,8 +364,13 @@ type Receiver interface {
 	//
 	// See Endpoint.RecvMsg for documentation on shared arguments.
 	//
-	// notify indicates if RecvNotify should be called.
-	Recv(ctx context.Context, data [][]byte, creds bool, numRights int, peek bool) (recvLen, msgLen int64, cm ControlMessages, CMTruncated bool, source tcpip.FullAddress, notify bool, err *syserr.Error)
+	// If peek is true, the first skip bytes of queued data are skipped. For
+	// packet sockets, these may span several messages, and msgLen is the
+	// length of the message past its skipped bytes.
+	//
+	// notify indicates if RecvNotify should be called. It may be set even if
+	// err is not nil.
+	Recv(ctx context.Context, data [][]byte, creds bool, numRights int, peek bool, skip int64) (recvLen, msgLen int64, cm ControlMessages, CMTruncated bool, source tcpip.FullAddress, notify bool, err *syserr.Error)
 
 	// RecvNotify notifies the Receiver of a successful Recv. This must not be
 	// called while holding any endpoint locks.
@@ -384,26 +410,28 @@ type queueReceiver struct {
 }
 
 // Recv implements Receiver.Recv.
-func (q *queueReceiver) Recv(ctx context.Context, data [][]byte, creds bool, numRights int, peek bool) (int64, int64, ControlMessages, bool, tcpip.FullAddress, bool, *syserr.Error) {
+func (q *queueReceiver) Recv(ctx context.Context, data [][]byte, creds bool, numRights int, peek bool, skip int64) (int64, int64, ControlMessages, bool, tcpip.FullAddress, bool, *syserr.Error) {
 	var m *message
 	var notify bool
 	var err *syserr.Error
 	if peek {
-		m, err = q.readQueue.Peek()
+		m, skip, err = q.readQueue.PeekAt(skip)
 	} else {
 		m, notify, err = q.readQueue.Dequeue()
+		skip = 0
 	}
 	if err != nil {
 		return 0, 0, ControlMessages{}, false, tcpip.FullAddress{}, false, err
 	}
-	src := []byte(m.Data)
+	src := []byte(m.Data)[skip:]
+	msgLen := int64(len(src))
 	var copied int64
 	for i := 0; i < len(data) && len(src) > 0; i++ {
 		n := copy(data[i], src)
 		copied += int64(n)
 		src = src[n:]
 	}
-	return copied, int64(len(m.Data)), m.Control, false, m.Address, notify, nil
+	return copied, msgLen, m.Control, false, m.Address, notify, nil
 }
 
 // RecvNotify implements Receiver.RecvNotify.
@@ -496,7 +524,7 @@ func (q *streamQueueReceiver) RecvMaxQueueSize() int64 {
 }
 
 // Recv implements Receiver.Recv.
-func (q *streamQueueReceiver) Recv(ctx context.Context, data [][]byte, wantCreds bool, numRights int, peek bool) (int64, int64, ControlMessages, bool, tcpip.FullAddress, bool, *syserr.Error) {
+func (q *streamQueueReceiver) Recv(ctx context.Context, data [][]byte, wantCreds bool, numRights int, peek bool, skip int64) (int64, int64, ControlMessages, bool, tcpip.FullAddress, bool, *syserr.Error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -518,12 +546,22 @@ func (q *streamQueueReceiver) Recv(ctx context.Context, data [][]byte, wantCreds
 	}
 
 	var copied int64
+	if peek && skip >= int64(len(q.buffer)) {
+		// Peek at data that is still in the readQueue. Messages in the
+		// readQueue are never consumed while peeking.
+		m, off, err := q.readQueue.PeekAt(skip - int64(len(q.buffer)))
+		if err != nil {
+			return 0, 0, ControlMessages{}, false, tcpip.FullAddress{}, notify, err
+		}
+		copied, _, _ = vecCopy(data, []byte(m.Data)[off:])
+		return copied, copied, m.Control, false, m.Address, notify, nil
+	}
 	if peek {
 		// Don't consume control message if we are peeking.
 		c := q.control.Clone()
 
 		// Don't consume data since we are peeking.
-		copied, _, _ = vecCopy(data, q.buffer)
+		copied, _, _ = vecCopy(data, q.buffer[skip:])
 
 		return copied, copied, c, false, q.addr, notify, nil
 	}
@@ -671,6 +709,11 @@ type ConnectedEndpoint interface {
 	// SetSendBufferSize is called when the endpoint's send buffer size is
 	// changed.
 	SetSendBufferSize(v int64) (newSz int64)
+
+	// Credentials returns the credentials of the ConnectedEndpoint, as
+	// reported to its peer by SO_PEERCRED. It may return nil if they are
+	// unknown.
+	Credentials() CredentialsControlMessage
 }
 
 // +stateify savable
@@ -688,6 +731,9 @@ type connectedEndpoint struct {
 
 		// Type implements Endpoint.Type.
 		Type() linux.SockType
+
+		// Credentials implements ConnectedEndpoint.Credentials.
+		Credentials() CredentialsControlMessage
 	}
 
 	writeQueue *queue
@@ -776,6 +822,11 @@ func (e *connectedEndpoint) SetSendBufferSize(v int64) (newSz int64) {
 	return v
 }
 
+// Credentials implements ConnectedEndpoint.Credentials.
+func (e *connectedEndpoint) Credentials() CredentialsControlMessage {
+	return e.endpoint.Credentials()
+}
+
 // baseEndpoint is an embeddable unix endpoint base used in both the connected
 // and connectionless unix domain socket Endpoint implementations.
 //
@@ -805,6 +856,16 @@ type baseEndpoint struct {
 
 	// ops is used to get socket level options.
 	ops tcpip.SocketOptions
+
+	// creds are the credentials reported to the endpoint's peers by
+	// SO_PEERCRED. They may be nil.
+	creds CredentialsControlMessage
+
+	// peekOffset is the offset in queued data at which reads with MSG_PEEK
+	// start, as set by SO_PEEK_OFF. It is advanced by peeking and retreats
+	// as data is consumed. It is negative if SO_PEEK_OFF is disabled, which
+	// is the default, so that peeking always starts at the first unread byte.
+	peekOffset int64
 }
 
 // EventRegister implements waiter.Waitable.EventRegister.
@@ -861,16 +922,30 @@ func (e *baseEndpoint) RecvMsg(ctx context.Context, data [][]byte, creds bool, n
 		return 0, 0, ControlMessages{}, false, nil, syserr.ErrNotConnected
 	}
 
-	recvLen, msgLen, cms, cmt, a, notify, err := receiver.Recv(ctx, data, creds, numRights, peek)
-	e.Unlock()
-	if err != nil {
-		return 0, 0, ControlMessages{}, false, nil, err
+	var skip int64
+	if peek && e.peekOffset > 0 {
+		skip = e.peekOffset
+	}
+	recvLen, msgLen, cms, cmt, a, notify, err := receiver.Recv(ctx, data, creds, numRights, peek, skip)
+	if err == nil && e.peekOffset >= 0 {
+		// Like Linux, peeking advances the offset by the amount of data
+		// read, and consuming a message moves it back by the message's
+		// length.
+		if peek {
+			e.peekOffset += recvLen
+		} else if e.peekOffset -= msgLen; e.peekOffset < 0 {
+			e.peekOffset = 0
+		}
 	}
+	e.Unlock()
 
 	var notifyFn func()
 	if notify {
 		notifyFn = receiver.RecvNotify
 	}
+	if err != nil {
+		return 0, 0, ControlMessages{}, false, notifyFn, err
+	}
 
 	if addr != nil {
 		*addr = a
@@ -909,12 +984,25 @@ func (e *baseEndpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 }
 
 func (e *baseEndpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
-	log.Warningf("Unsupported socket option: %d", opt)
+	switch opt {
+	case tcpip.PeekOffsetOption:
+		e.Lock()
+		e.peekOffset = int64(v)
+		e.Unlock()
+	default:
+		log.Warningf("Unsupported socket option: %d", opt)
+	}
 	return nil
 }
 
 func (e *baseEndpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 	switch opt {
+	case tcpip.PeekOffsetOption:
+		e.Lock()
+		v := e.peekOffset
+		e.Unlock()
+		return int(v), nil
+
 	case tcpip.ReceiveQueueSizeOption:
 		v := 0
 		e.Lock()
@@ -1017,6 +1105,31 @@ func (e *baseEndpoint) GetRemoteAddress() (tcpip.FullAddress, tcpip.Error) {
 	return tcpip.FullAddress{}, &tcpip.ErrNotConnected{}
 }
 
+// SetCredentials implements Endpoint.SetCredentials.
+func (e *baseEndpoint) SetCredentials(creds CredentialsControlMessage) {
+	e.Lock()
+	defer e.Unlock()
+	e.creds = creds
+}
+
+// Credentials implements ConnectedEndpoint.Credentials.
+func (e *baseEndpoint) Credentials() CredentialsControlMessage {
+	e.Lock()
+	defer e.Unlock()
+	return e.creds
+}
+
+// PeerCredentials implements Endpoint.PeerCredentials.
+func (e *baseEndpoint) PeerCredentials() CredentialsControlMessage {
+	e.Lock()
+	c := e.connected
+	e.Unlock()
+	if c != nil {
+		return c.Credentials()
+	}
+	return nil
+}
+
 // Release implements BoundEndpoint.Release.
 func (*baseEndpoint) Release(context.Context) {
 	// Binding a baseEndpoint doesn't take a reference.
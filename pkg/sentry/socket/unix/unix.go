@@ -31,7 +31,9 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/fs/fsutil"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/socket"
 	"gvisor.dev/gvisor/pkg/sentry/socket/control"
@@ -116,7 +118,7 @@ type socketOpsCommon struct {
 	// socket if it is bound to an abstract socket namespace. Once the socket is
 	// bound, they cannot be modified.
 	abstractName      string
-	abstractNamespace *kernel.AbstractSocketNamespace
+	abstractNamespace *inet.AbstractSocketNamespace
 }
 
 func (s *socketOpsCommon) isPacket() bool {
@@ -195,12 +197,41 @@ func (s *SocketOperations) Ioctl(ctx context.Context, _ *fs.File, io usermem.IO,
 // GetSockOpt implements the linux syscall getsockopt(2) for sockets backed by
 // a transport.Endpoint.
 func (s *SocketOperations) GetSockOpt(t *kernel.Task, level, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if level == linux.SOL_SOCKET && name == linux.SO_PEERCRED {
+		return s.getPeerCred(t, outLen)
+	}
 	return netstack.GetSockOpt(t, s, s.ep, linux.AF_UNIX, s.ep.Type(), level, name, outPtr, outLen)
 }
 
+// getPeerCred implements getsockopt(SO_PEERCRED). Like in Linux, the
+// credentials are those of the peer when it connected, started listening or
+// created the socket pair, translated into t's namespaces.
+func (s *socketOpsCommon) getPeerCred(t *kernel.Task, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if outLen < unix.SizeofUcred {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	// Like Linux, report invalid IDs if the credentials of the peer are
+	// unknown.
+	creds := linux.ControlMessageCredentials{
+		UID: uint32(auth.NoID),
+		GID: uint32(auth.NoID),
+	}
+	if c, ok := s.ep.PeerCredentials().(control.SCMCredentials); ok {
+		pid, uid, gid := c.Credentials(t)
+		creds = linux.ControlMessageCredentials{
+			PID: int32(pid),
+			UID: uint32(uid),
+			GID: uint32(gid),
+		}
+	}
+	return &creds, nil
+}
+
 // Listen implements the linux syscall listen(2) for sockets backed by
 // a transport.Endpoint.
 func (s *socketOpsCommon) Listen(t *kernel.Task, backlog int) *syserr.Error {
+	s.ep.SetCredentials(control.MakeCreds(t))
 	return s.ep.Listen(t, backlog)
 }
 
@@ -287,9 +318,6 @@ func (s *SocketOperations) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 
 	if p[0] == 0 {
 		// Abstract socket. See net/unix/af_unix.c:unix_bind_abstract().
-		if t.IsNetworkNamespaced() {
-			return syserr.ErrInvalidEndpointState
-		}
 		asn := t.AbstractSockets()
 		name := p[1:]
 		if err := asn.Bind(t, name, bep, s); err != nil {
@@ -372,10 +400,6 @@ func extractEndpoint(t *kernel.Task, sockaddr []byte) (transport.BoundEndpoint,
 
 	// Is it abstract?
 	if path[0] == 0 {
-		if t.IsNetworkNamespaced() {
-			return nil, syserr.ErrInvalidArgument
-		}
-
 		ep := t.AbstractSockets().BoundEndpoint(path[1:])
 		if ep == nil {
 			// No socket found.
@@ -418,6 +442,7 @@ func (s *socketOpsCommon) Connect(t *kernel.Task, sockaddr []byte, blocking bool
 	defer ep.Release(t)
 
 	// Connect the server endpoint.
+	s.ep.SetCredentials(control.MakeCreds(t))
 	err = s.ep.Connect(t, ep)
 
 	if err == syserr.ErrWrongProtocolForSocket {
@@ -790,6 +815,8 @@ func (*provider) Pair(t *kernel.Task, stype linux.SockType, protocol int) (*fs.F
 
 	// Create the endpoints and sockets.
 	ep1, ep2 := transport.NewPair(t, stype, t.Kernel())
+	ep1.SetCredentials(control.MakeCreds(t))
+	ep2.SetCredentials(control.MakeCreds(t))
 	s1 := New(t, ep1, stype)
 	s2 := New(t, ep2, stype)
 
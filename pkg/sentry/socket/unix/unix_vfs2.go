@@ -115,6 +115,9 @@ func (s *SocketVFS2) Release(ctx context.Context) {
 // GetSockOpt implements the linux syscall getsockopt(2) for sockets backed by
 // a transport.Endpoint.
 func (s *SocketVFS2) GetSockOpt(t *kernel.Task, level, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if level == linux.SOL_SOCKET && name == linux.SO_PEERCRED {
+		return s.getPeerCred(t, outLen)
+	}
 	return netstack.GetSockOpt(t, s, s.ep, linux.AF_UNIX, s.ep.Type(), level, name, outPtr, outLen)
 }
 
@@ -201,9 +204,6 @@ func (s *SocketVFS2) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 
 	if p[0] == 0 {
 		// Abstract socket. See net/unix/af_unix.c:unix_bind_abstract().
-		if t.IsNetworkNamespaced() {
-			return syserr.ErrInvalidEndpointState
-		}
 		asn := t.AbstractSockets()
 		name := p[1:]
 		if err := asn.Bind(t, name, bep, s); err != nil {
@@ -404,6 +404,8 @@ func (*providerVFS2) Pair(t *kernel.Task, stype linux.SockType, protocol int) (*
 
 	// Create the endpoints and sockets.
 	ep1, ep2 := transport.NewPair(t, stype, t.Kernel())
+	ep1.SetCredentials(control.MakeCreds(t))
+	ep2.SetCredentials(control.MakeCreds(t))
 	s1, err := NewSockfsFile(t, ep1, stype)
 	if err != nil {
 		ep1.Close(t)
@@ -0,0 +1,833 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsock
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/fdnotifier"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/sockfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	sizeOfInt32  = 4
+	sizeOfUint64 = 8
+
+	// The buffer sizes reported for SO_VM_SOCKETS_BUFFER_*, from
+	// include/net/af_vsock.h. The actual buffering is done by the host
+	// sockets carrying the connections.
+	defaultBufferSize = 1024 * 256
+	minBufferSize     = 128
+	maxBufferSize     = 1024 * 256
+)
+
+// pendingConn is a connection waiting to be accepted.
+//
+// +stateify savable
+type pendingConn struct {
+	// fd is the host stream socket carrying the connection.
+	fd int
+
+	// peer is the address of the connecting socket.
+	peer linux.SockAddrVM
+}
+
+// socketVFS2 implements socket.SocketVFS2 for AF_VSOCK stream sockets.
+//
+// The data of a connected socket is carried by a host stream socket, so that
+// EOF and resets propagate from the peer as they would on the host.
+//
+// +stateify savable
+type socketVFS2 struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.LockFD
+
+	socket.SendReceiveTimeout
+
+	stack *Stack `state:"nosave"`
+	queue waiter.Queue
+
+	mu sync.Mutex `state:"nosave"`
+
+	// local is the address the socket is bound to. local.Port is
+	// VMADDR_PORT_ANY if the socket isn't bound.
+	//
+	// +checklocks:mu
+	local linux.SockAddrVM
+
+	// ownsPort is true if the socket holds local.Port in stack.
+	//
+	// +checklocks:mu
+	ownsPort bool
+
+	// remote is the address of the peer of a connected socket.
+	//
+	// +checklocks:mu
+	remote linux.SockAddrVM
+
+	// fd is the host stream socket carrying the data of a connected socket,
+	// or -1. It is registered with fdnotifier and is non-blocking, so that
+	// blocking is handled in the sentry.
+	//
+	// +checklocks:mu
+	fd int
+
+	// listening is true if the socket accepts connections.
+	//
+	// +checklocks:mu
+	listening bool
+
+	// backlog is the listen(2) backlog of a listening socket.
+	//
+	// +checklocks:mu
+	backlog int
+
+	// pending holds the connections waiting to be accepted.
+	//
+	// +checklocks:mu
+	pending []pendingConn
+}
+
+var _ = socket.SocketVFS2(&socketVFS2{})
+
+// newSocket returns a socket of stack. If fd isn't -1, the socket is
+// connected to remote through the host stream socket fd, and takes ownership
+// of it.
+func newSocket(t *kernel.Task, stack *Stack, fd int, local, remote linux.SockAddrVM, flags uint32) (*vfs.FileDescription, *syserr.Error) {
+	mnt := t.Kernel().SocketMount()
+	d := sockfs.NewDentry(t, mnt)
+	defer d.DecRef(t)
+
+	s := &socketVFS2{
+		stack:  stack,
+		local:  local,
+		remote: remote,
+		fd:     fd,
+	}
+	s.LockFD.Init(&vfs.FileLocks{})
+	if fd >= 0 {
+		if err := fdnotifier.AddFD(int32(fd), &s.queue); err != nil {
+			return nil, syserr.FromError(err)
+		}
+	}
+	vfsfd := &s.vfsfd
+	if err := vfsfd.Init(s, linux.O_RDWR|(flags&linux.O_NONBLOCK), mnt, d, &vfs.FileDescriptionOptions{
+		DenyPRead:         true,
+		DenyPWrite:        true,
+		UseDentryMetadata: true,
+	}); err != nil {
+		if fd >= 0 {
+			fdnotifier.RemoveFD(int32(fd))
+		}
+		return nil, syserr.FromError(err)
+	}
+	return vfsfd, nil
+}
+
+// unboundAddr is the address of an unbound socket.
+func unboundAddr() linux.SockAddrVM {
+	return linux.SockAddrVM{
+		Family: linux.AF_VSOCK,
+		CID:    linux.VMADDR_CID_ANY,
+		Port:   linux.VMADDR_PORT_ANY,
+	}
+}
+
+// parseAddr parses a sockaddr_vm, as in net/vmw_vsock/vsock_addr.c.
+func parseAddr(sockaddr []byte) (linux.SockAddrVM, *syserr.Error) {
+	var addr linux.SockAddrVM
+	if len(sockaddr) < linux.SockAddrVMSize {
+		return addr, syserr.ErrInvalidArgument
+	}
+	addr.UnmarshalUnsafe(sockaddr[:linux.SockAddrVMSize])
+	if addr.Family != linux.AF_VSOCK {
+		return addr, syserr.ErrAddressFamilyNotSupported
+	}
+	if addr.Flags&^linux.VMADDR_FLAG_TO_HOST != 0 {
+		return addr, syserr.ErrInvalidArgument
+	}
+	return addr, nil
+}
+
+// hostFD returns the host stream socket of a connected socket, or -1.
+func (s *socketVFS2) hostFD() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fd
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (s *socketVFS2) Release(ctx context.Context) {
+	kernel.KernelFromContext(ctx).DeleteSocketVFS2(&s.vfsfd)
+
+	s.mu.Lock()
+	fd := s.fd
+	s.fd = -1
+	pending := s.pending
+	s.pending = nil
+	s.listening = false
+	port, ownsPort := s.local.Port, s.ownsPort
+	s.ownsPort = false
+	s.mu.Unlock()
+
+	// Closing the host sockets of the connections that were never accepted
+	// resets them.
+	for _, c := range pending {
+		_ = unix.Close(c.fd)
+	}
+	if fd >= 0 {
+		fdnotifier.RemoveFD(int32(fd))
+		_ = unix.Close(fd)
+	}
+	if ownsPort {
+		s.stack.unbind(s, port)
+	}
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (s *socketVFS2) Readiness(mask waiter.EventMask) waiter.EventMask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fd >= 0 {
+		return fdnotifier.NonBlockingPoll(int32(s.fd), mask)
+	}
+	if s.listening && len(s.pending) > 0 {
+		return mask & waiter.ReadableEvents
+	}
+	return 0
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (s *socketVFS2) EventRegister(e *waiter.Entry) error {
+	s.queue.EventRegister(e)
+	if fd := s.hostFD(); fd >= 0 {
+		if err := fdnotifier.UpdateFD(int32(fd)); err != nil {
+			s.queue.EventUnregister(e)
+			return err
+		}
+	}
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (s *socketVFS2) EventUnregister(e *waiter.Entry) {
+	s.queue.EventUnregister(e)
+	if fd := s.hostFD(); fd >= 0 {
+		if err := fdnotifier.UpdateFD(int32(fd)); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Epollable implements FileDescriptionImpl.Epollable.
+func (s *socketVFS2) Epollable() bool {
+	return true
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (s *socketVFS2) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	return 0, linuxerr.ESPIPE
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (s *socketVFS2) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	// All flags other than RWF_NOWAIT should be ignored.
+	// TODO(gvisor.dev/issue/2601): Support RWF_NOWAIT.
+	if opts.Flags != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	fd := s.hostFD()
+	if fd < 0 {
+		return 0, linuxerr.ENOTCONN
+	}
+	return dst.CopyOutFrom(ctx, hostReader(fd, false /* peek */))
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (s *socketVFS2) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	return 0, linuxerr.ESPIPE
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (s *socketVFS2) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	// All flags other than RWF_NOWAIT should be ignored.
+	// TODO(gvisor.dev/issue/2601): Support RWF_NOWAIT.
+	if opts.Flags != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	fd := s.hostFD()
+	if fd < 0 {
+		return 0, linuxerr.ENOTCONN
+	}
+	return src.CopyInTo(ctx, hostWriter(fd))
+}
+
+// hostReader returns a safemem.Reader that reads from the host socket fd
+// without blocking.
+func hostReader(fd int, peek bool) safemem.Reader {
+	return safemem.ReaderFunc(func(dsts safemem.BlockSeq) (uint64, error) {
+		if dsts.IsEmpty() {
+			return 0, nil
+		}
+		return recvmsg(fd, safemem.IovecsFromBlockSeq(dsts), peek)
+	})
+}
+
+// hostWriter returns a safemem.Writer that writes to the host socket fd
+// without blocking.
+func hostWriter(fd int) safemem.Writer {
+	return safemem.WriterFunc(func(srcs safemem.BlockSeq) (uint64, error) {
+		if srcs.IsEmpty() {
+			return 0, nil
+		}
+		return sendmsg(fd, safemem.IovecsFromBlockSeq(srcs))
+	})
+}
+
+// Connect implements socket.Socket.Connect.
+//
+// Connections are established synchronously, so blocking is ignored.
+func (s *socketVFS2) Connect(t *kernel.Task, sockaddr []byte, blocking bool) *syserr.Error {
+	addr, err := parseAddr(sockaddr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fd >= 0 {
+		return syserr.ErrAlreadyConnected
+	}
+	if s.listening {
+		return syserr.ErrInvalidArgument
+	}
+	local := s.stack.isLocal(addr.CID)
+	if !local && (addr.CID != linux.VMADDR_CID_HOST || s.stack.transport == nil) {
+		return syserr.ErrNetworkUnreachable
+	}
+
+	// As in Linux, connecting binds unbound sockets to an ephemeral port.
+	if s.local.Port == linux.VMADDR_PORT_ANY {
+		port, err := s.stack.bind(s, linux.VMADDR_PORT_ANY)
+		if err != nil {
+			return err
+		}
+		s.local = linux.SockAddrVM{
+			Family: linux.AF_VSOCK,
+			CID:    s.stack.cid,
+			Port:   port,
+		}
+		s.ownsPort = true
+	}
+
+	var fd int
+	if local {
+		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return syserr.FromError(err)
+		}
+		peer := linux.SockAddrVM{
+			Family: linux.AF_VSOCK,
+			CID:    s.stack.cid,
+			Port:   s.local.Port,
+		}
+		if err := s.stack.enqueue(addr.Port, fds[1], peer, nil); err != nil {
+			_ = unix.Close(fds[0])
+			_ = unix.Close(fds[1])
+			return err
+		}
+		fd = fds[0]
+	} else {
+		var err error
+		fd, err = s.stack.transport.Connect(addr.Port)
+		switch err {
+		case nil:
+		case unix.ENOENT, unix.ECONNREFUSED, unix.EAGAIN:
+			// Nothing is listening on the host, or its backlog is full.
+			// Linux resets the connection in both cases.
+			return syserr.ErrConnectionReset
+		default:
+			return syserr.FromError(err)
+		}
+	}
+	if err := fdnotifier.AddFD(int32(fd), &s.queue); err != nil {
+		_ = unix.Close(fd)
+		return syserr.FromError(err)
+	}
+	s.fd = fd
+	s.remote = linux.SockAddrVM{
+		Family: linux.AF_VSOCK,
+		CID:    addr.CID,
+		Port:   addr.Port,
+	}
+	return nil
+}
+
+// enqueue queues a connection carried by the host stream socket fd on a
+// listening socket. If ack isn't nil, it is called before the connection
+// becomes visible to Accept. On success, s takes ownership of fd.
+func (s *socketVFS2) enqueue(fd int, peer linux.SockAddrVM, ack func() error) *syserr.Error {
+	s.mu.Lock()
+	// As in Linux, the backlog is full when it is exceeded.
+	if !s.listening || len(s.pending) > s.backlog {
+		s.mu.Unlock()
+		return syserr.ErrConnectionReset
+	}
+	if ack != nil {
+		if err := ack(); err != nil {
+			s.mu.Unlock()
+			return syserr.FromError(err)
+		}
+	}
+	s.pending = append(s.pending, pendingConn{fd: fd, peer: peer})
+	s.mu.Unlock()
+	s.queue.Notify(waiter.ReadableEvents)
+	return nil
+}
+
+// dequeue returns the next connection waiting to be accepted.
+func (s *socketVFS2) dequeue() (pendingConn, *syserr.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.listening {
+		return pendingConn{}, syserr.ErrInvalidArgument
+	}
+	if len(s.pending) == 0 {
+		return pendingConn{}, syserr.ErrWouldBlock
+	}
+	c := s.pending[0]
+	s.pending = s.pending[1:]
+	return c, nil
+}
+
+// Accept implements socket.Socket.Accept.
+func (s *socketVFS2) Accept(t *kernel.Task, peerRequested bool, flags int, blocking bool) (int32, linux.SockAddr, uint32, *syserr.Error) {
+	c, err := s.dequeue()
+	if err == syserr.ErrWouldBlock && blocking {
+		e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+		if err := s.EventRegister(&e); err != nil {
+			return 0, nil, 0, syserr.FromError(err)
+		}
+		defer s.EventUnregister(&e)
+		for {
+			c, err = s.dequeue()
+			if err != syserr.ErrWouldBlock {
+				break
+			}
+			if err := t.Block(ch); err != nil {
+				return 0, nil, 0, syserr.FromError(err)
+			}
+		}
+	}
+	if err != nil {
+		return 0, nil, 0, err
+	}
+
+	s.mu.Lock()
+	local := linux.SockAddrVM{
+		Family: linux.AF_VSOCK,
+		CID:    s.stack.cid,
+		Port:   s.local.Port,
+	}
+	s.mu.Unlock()
+	f, err := newSocket(t, s.stack, c.fd, local, c.peer, uint32(flags&linux.SOCK_NONBLOCK))
+	if err != nil {
+		_ = unix.Close(c.fd)
+		return 0, nil, 0, err
+	}
+	defer f.DecRef(t)
+
+	fd, kerr := t.NewFDFromVFS2(0, f, kernel.FDFlags{
+		CloseOnExec: flags&linux.SOCK_CLOEXEC != 0,
+	})
+	t.Kernel().RecordSocketVFS2(f)
+
+	var peer linux.SockAddr
+	var peerLen uint32
+	if peerRequested {
+		addr := c.peer
+		peer, peerLen = &addr, linux.SockAddrVMSize
+	}
+	return fd, peer, peerLen, syserr.FromError(kerr)
+}
+
+// Bind implements socket.Socket.Bind.
+func (s *socketVFS2) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
+	addr, err := parseAddr(sockaddr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.local.Port != linux.VMADDR_PORT_ANY {
+		return syserr.ErrInvalidArgument
+	}
+	if addr.CID != linux.VMADDR_CID_ANY && !s.stack.isLocal(addr.CID) {
+		return syserr.ErrAddressNotAvailable
+	}
+	if addr.Port != linux.VMADDR_PORT_ANY && addr.Port <= lastReservedPort && !t.HasCapability(linux.CAP_NET_BIND_SERVICE) {
+		return syserr.ErrPermissionDenied
+	}
+	port, err := s.stack.bind(s, addr.Port)
+	if err != nil {
+		return err
+	}
+	s.local = linux.SockAddrVM{
+		Family: linux.AF_VSOCK,
+		CID:    addr.CID,
+		Port:   port,
+	}
+	s.ownsPort = true
+	return nil
+}
+
+// Listen implements socket.Socket.Listen.
+func (s *socketVFS2) Listen(t *kernel.Task, backlog int) *syserr.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fd >= 0 || s.local.Port == linux.VMADDR_PORT_ANY {
+		return syserr.ErrInvalidArgument
+	}
+	s.listening = true
+	s.backlog = backlog
+	return nil
+}
+
+// Shutdown implements socket.Socket.Shutdown.
+func (s *socketVFS2) Shutdown(t *kernel.Task, how int) *syserr.Error {
+	switch how {
+	case linux.SHUT_RD, linux.SHUT_WR, linux.SHUT_RDWR:
+	default:
+		return syserr.ErrInvalidArgument
+	}
+	fd := s.hostFD()
+	if fd < 0 {
+		return syserr.ErrNotConnected
+	}
+	return syserr.FromError(unix.Shutdown(fd, how))
+}
+
+// GetSockOpt implements socket.Socket.GetSockOpt.
+func (s *socketVFS2) GetSockOpt(t *kernel.Task, level int, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	switch level {
+	case linux.SOL_SOCKET:
+		switch name {
+		case linux.SO_TYPE, linux.SO_DOMAIN, linux.SO_PROTOCOL, linux.SO_ERROR, linux.SO_ACCEPTCONN:
+			if outLen < sizeOfInt32 {
+				return nil, syserr.ErrInvalidArgument
+			}
+			var v int32
+			switch name {
+			case linux.SO_TYPE:
+				v = int32(linux.SOCK_STREAM)
+			case linux.SO_DOMAIN:
+				v = linux.AF_VSOCK
+			case linux.SO_ACCEPTCONN:
+				s.mu.Lock()
+				if s.listening {
+					v = 1
+				}
+				s.mu.Unlock()
+			}
+			// SO_PROTOCOL is always 0, and since connections are established
+			// synchronously there is never a pending SO_ERROR.
+			return primitive.AllocateInt32(v), nil
+
+		case linux.SO_SNDTIMEO:
+			if outLen < linux.SizeOfTimeval {
+				return nil, syserr.ErrInvalidArgument
+			}
+			sendTimeout := linux.NsecToTimeval(s.SendTimeout())
+			return &sendTimeout, nil
+
+		case linux.SO_RCVTIMEO:
+			if outLen < linux.SizeOfTimeval {
+				return nil, syserr.ErrInvalidArgument
+			}
+			recvTimeout := linux.NsecToTimeval(s.RecvTimeout())
+			return &recvTimeout, nil
+		}
+
+	case linux.AF_VSOCK:
+		var v uint64
+		switch name {
+		case linux.SO_VM_SOCKETS_BUFFER_SIZE:
+			v = defaultBufferSize
+		case linux.SO_VM_SOCKETS_BUFFER_MIN_SIZE:
+			v = minBufferSize
+		case linux.SO_VM_SOCKETS_BUFFER_MAX_SIZE:
+			v = maxBufferSize
+		default:
+			return nil, syserr.ErrProtocolNotAvailable
+		}
+		if outLen < sizeOfUint64 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		return primitive.AllocateUint64(v), nil
+	}
+	return nil, syserr.ErrProtocolNotAvailable
+}
+
+// SetSockOpt implements socket.Socket.SetSockOpt.
+func (s *socketVFS2) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *syserr.Error {
+	switch level {
+	case linux.SOL_SOCKET:
+		switch name {
+		case linux.SO_SNDTIMEO, linux.SO_RCVTIMEO:
+			if len(opt) < linux.SizeOfTimeval {
+				return syserr.ErrInvalidArgument
+			}
+			var v linux.Timeval
+			v.UnmarshalBytes(opt)
+			if v.Usec < 0 || v.Usec >= int64(time.Second/time.Microsecond) {
+				return syserr.ErrDomain
+			}
+			if name == linux.SO_SNDTIMEO {
+				s.SetSendTimeout(v.ToNsecCapped())
+			} else {
+				s.SetRecvTimeout(v.ToNsecCapped())
+			}
+			return nil
+		}
+		// Other options, such as buffer sizes, are determined by the host
+		// sockets carrying the connections. Accept them as netstack does.
+		return nil
+
+	case linux.AF_VSOCK:
+		switch name {
+		case linux.SO_VM_SOCKETS_BUFFER_SIZE, linux.SO_VM_SOCKETS_BUFFER_MIN_SIZE, linux.SO_VM_SOCKETS_BUFFER_MAX_SIZE:
+			if len(opt) < sizeOfUint64 {
+				return syserr.ErrInvalidArgument
+			}
+			return nil
+		}
+	}
+	return syserr.ErrProtocolNotAvailable
+}
+
+// GetSockName implements socket.Socket.GetSockName.
+func (s *socketVFS2) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Error) {
+	s.mu.Lock()
+	addr := s.local
+	s.mu.Unlock()
+	return &addr, linux.SockAddrVMSize, nil
+}
+
+// GetPeerName implements socket.Socket.GetPeerName.
+func (s *socketVFS2) GetPeerName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fd < 0 {
+		return nil, 0, syserr.ErrNotConnected
+	}
+	addr := s.remote
+	return &addr, linux.SockAddrVMSize, nil
+}
+
+// RecvMsg implements socket.Socket.RecvMsg.
+func (s *socketVFS2) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, senderRequested bool, controlLen uint64) (int, int, linux.SockAddr, uint32, socket.ControlMessages, *syserr.Error) {
+	if flags&(linux.MSG_OOB|linux.MSG_ERRQUEUE) != 0 {
+		return 0, 0, nil, 0, socket.ControlMessages{}, syserr.ErrNotSupported
+	}
+	s.mu.Lock()
+	fd, remote := s.fd, s.remote
+	s.mu.Unlock()
+	if fd < 0 {
+		return 0, 0, nil, 0, socket.ControlMessages{}, syserr.ErrNotConnected
+	}
+
+	peek := flags&linux.MSG_PEEK != 0
+	waitAll := flags&linux.MSG_WAITALL != 0 && !peek
+	var (
+		total int64
+		ch    chan struct{}
+	)
+	for {
+		n, err := dst.CopyOutFrom(t, hostReader(fd, peek))
+		total += n
+		dst = dst.DropFirst64(n)
+		if err == nil && (n == 0 || !waitAll || dst.NumBytes() == 0) {
+			// A read of 0 bytes is EOF.
+			break
+		}
+		if err != nil && err != linuxerr.ErrWouldBlock {
+			if total == 0 {
+				return 0, 0, nil, 0, socket.ControlMessages{}, syserr.FromError(err)
+			}
+			break
+		}
+		if err == linuxerr.ErrWouldBlock && (flags&linux.MSG_DONTWAIT != 0 || (total > 0 && !waitAll)) {
+			if total == 0 {
+				return 0, 0, nil, 0, socket.ControlMessages{}, syserr.ErrWouldBlock
+			}
+			break
+		}
+		if ch == nil {
+			var e waiter.Entry
+			e, ch = waiter.NewChannelEntry(waiter.ReadableEvents)
+			if err := s.EventRegister(&e); err != nil {
+				return 0, 0, nil, 0, socket.ControlMessages{}, syserr.FromError(err)
+			}
+			defer s.EventUnregister(&e)
+			continue
+		}
+		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
+			if total > 0 {
+				break
+			}
+			if linuxerr.Equals(linuxerr.ETIMEDOUT, err) {
+				return 0, 0, nil, 0, socket.ControlMessages{}, syserr.ErrTryAgain
+			}
+			return 0, 0, nil, 0, socket.ControlMessages{}, syserr.FromError(err)
+		}
+	}
+
+	var sender linux.SockAddr
+	var senderLen uint32
+	if senderRequested {
+		sender, senderLen = &remote, linux.SockAddrVMSize
+	}
+	return int(total), 0, sender, senderLen, socket.ControlMessages{}, nil
+}
+
+// SendMsg implements socket.Socket.SendMsg.
+func (s *socketVFS2) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags int, haveDeadline bool, deadline ktime.Time, controlMessages socket.ControlMessages) (int, *syserr.Error) {
+	if flags&linux.MSG_OOB != 0 {
+		return 0, syserr.ErrNotSupported
+	}
+	fd := s.hostFD()
+	if len(to) != 0 {
+		if fd >= 0 {
+			return 0, syserr.ErrAlreadyConnected
+		}
+		return 0, syserr.ErrNotSupported
+	}
+	if fd < 0 {
+		return 0, syserr.ErrNotConnected
+	}
+
+	var (
+		total int64
+		ch    chan struct{}
+	)
+	for {
+		n, err := src.CopyInTo(t, hostWriter(fd))
+		total += n
+		src = src.DropFirst64(n)
+		if err == nil && src.NumBytes() == 0 {
+			break
+		}
+		if err != nil && err != linuxerr.ErrWouldBlock {
+			if total == 0 {
+				return 0, syserr.FromError(err)
+			}
+			break
+		}
+		if err == linuxerr.ErrWouldBlock && flags&linux.MSG_DONTWAIT != 0 {
+			if total == 0 {
+				return 0, syserr.ErrWouldBlock
+			}
+			break
+		}
+		if err == nil {
+			// Partial write; try again before blocking.
+			continue
+		}
+		if ch == nil {
+			var e waiter.Entry
+			e, ch = waiter.NewChannelEntry(waiter.WritableEvents)
+			if err := s.EventRegister(&e); err != nil {
+				return 0, syserr.FromError(err)
+			}
+			defer s.EventUnregister(&e)
+			continue
+		}
+		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
+			if total > 0 {
+				break
+			}
+			if linuxerr.Equals(linuxerr.ETIMEDOUT, err) {
+				return 0, syserr.ErrTryAgain
+			}
+			return 0, syserr.FromError(err)
+		}
+	}
+	return int(total), nil
+}
+
+// State implements socket.Socket.State.
+func (s *socketVFS2) State() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.fd >= 0:
+		return linux.TCP_ESTABLISHED
+	case s.listening:
+		return linux.TCP_LISTEN
+	default:
+		return linux.TCP_CLOSE
+	}
+}
+
+// Type implements socket.Socket.Type.
+func (s *socketVFS2) Type() (family int, skType linux.SockType, protocol int) {
+	return linux.AF_VSOCK, linux.SOCK_STREAM, 0
+}
+
+// provider implements socket.ProviderVFS2 for AF_VSOCK.
+type provider struct {
+	stack *Stack
+}
+
+// Socket implements socket.ProviderVFS2.Socket.
+func (p *provider) Socket(t *kernel.Task, stype linux.SockType, protocol int) (*vfs.FileDescription, *syserr.Error) {
+	switch stype {
+	case linux.SOCK_STREAM:
+	case linux.SOCK_SEQPACKET:
+		// Message boundaries can't be carried by the host stream sockets.
+		return nil, syserr.ErrProtocolNotSupported
+	default:
+		return nil, syserr.ErrSocketNotSupported
+	}
+	if protocol != 0 && protocol != linux.AF_VSOCK {
+		return nil, syserr.ErrProtocolNotSupported
+	}
+	return newSocket(t, p.stack, -1, unboundAddr(), linux.SockAddrVM{}, 0)
+}
+
+// Pair implements socket.ProviderVFS2.Pair.
+func (p *provider) Pair(t *kernel.Task, stype linux.SockType, protocol int) (*vfs.FileDescription, *vfs.FileDescription, *syserr.Error) {
+	// Not supported by AF_VSOCK.
+	return nil, nil, syserr.ErrNotSupported
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsock
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+)
+
+// recvmsg reads from the host stream socket fd into iovs without blocking.
+//
+// Preconditions: len(iovs) != 0.
+func recvmsg(fd int, iovs []unix.Iovec, peek bool) (uint64, error) {
+	// MSG_TRUNC has no effect on stream sockets, but is required by the
+	// sentry's syscall filters.
+	flags := unix.MSG_DONTWAIT | unix.MSG_TRUNC
+	if peek {
+		flags |= unix.MSG_PEEK
+	}
+	msg := unix.Msghdr{Iov: &iovs[0]}
+	msg.SetIovlen(len(iovs))
+	n, _, errno := unix.Syscall(unix.SYS_RECVMSG, uintptr(fd), uintptr(unsafe.Pointer(&msg)), uintptr(flags))
+	if errno != 0 {
+		return 0, translateIOSyscallError(errno)
+	}
+	return uint64(n), nil
+}
+
+// sendmsg writes iovs to the host stream socket fd without blocking.
+//
+// Preconditions: len(iovs) != 0.
+func sendmsg(fd int, iovs []unix.Iovec) (uint64, error) {
+	msg := unix.Msghdr{Iov: &iovs[0]}
+	msg.SetIovlen(len(iovs))
+	n, _, errno := unix.Syscall(unix.SYS_SENDMSG, uintptr(fd), uintptr(unsafe.Pointer(&msg)), unix.MSG_DONTWAIT|unix.MSG_NOSIGNAL)
+	if errno != 0 {
+		return 0, translateIOSyscallError(errno)
+	}
+	return uint64(n), nil
+}
+
+func translateIOSyscallError(err error) error {
+	if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
+		return linuxerr.ErrWouldBlock
+	}
+	return err
+}
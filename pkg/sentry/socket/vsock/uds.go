@@ -0,0 +1,225 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/fdnotifier"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// handshakeTimeout bounds the time the host has to send its CONNECT
+	// request after connecting.
+	handshakeTimeout = 5 * time.Second
+
+	// maxRequestLen is the maximum length of a CONNECT request, including
+	// the newline.
+	maxRequestLen = 32
+)
+
+// UDSTransport is a Transport that follows Firecracker's convention for
+// carrying vsock connections over host unix domain sockets:
+//
+//   - The host connects to the socket listening at <path> and sends
+//     "CONNECT <port>\n". Once a socket of the sandbox listening on port has
+//     queued the connection, the sandbox replies with "OK <host port>\n".
+//
+//   - The sandbox connects to port on the host by connecting to the socket
+//     at <path>_<port>.
+type UDSTransport struct {
+	// listenFD is the socket listening at <path>, or -1 if the host can't
+	// initiate connections.
+	listenFD int
+
+	// dirFD is an O_PATH FD for the directory containing <path>. Sockets in
+	// it are reached through /proc/self/fd, since the sentry can't otherwise
+	// reach the host's filesystem.
+	dirFD int
+
+	// name is the base name of <path>.
+	name string
+
+	// queue is notified when listenFD is readable.
+	queue waiter.Queue
+}
+
+// NewUDSTransport returns a UDSTransport for the socket named name in the
+// directory open at dirFD. listenFD, if not -1, is listening at that socket.
+// The UDSTransport takes ownership of both FDs.
+func NewUDSTransport(listenFD, dirFD int, name string) (*UDSTransport, error) {
+	u := &UDSTransport{
+		listenFD: listenFD,
+		dirFD:    dirFD,
+		name:     name,
+	}
+	if path := u.hostPath(linux.VMADDR_PORT_ANY); len(path) >= linux.UnixPathMax {
+		return nil, fmt.Errorf("vsock socket path %q is too long", path)
+	}
+	if listenFD >= 0 {
+		if err := unix.SetNonblock(listenFD, true); err != nil {
+			return nil, fmt.Errorf("setting vsock listening socket non-blocking: %w", err)
+		}
+	}
+	return u, nil
+}
+
+// hostPath returns the path at which the host listens on port.
+func (u *UDSTransport) hostPath(port uint32) string {
+	return fmt.Sprintf("/proc/self/fd/%d/%s_%d", u.dirFD, u.name, port)
+}
+
+// Connect implements Transport.Connect.
+func (u *UDSTransport) Connect(port uint32) (int, error) {
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	if err := unix.Connect(fd, &unix.SockaddrUnix{Name: u.hostPath(port)}); err != nil {
+		_ = unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// Serve implements Transport.Serve.
+func (u *UDSTransport) Serve(s *Stack) {
+	if u.listenFD < 0 {
+		return
+	}
+	if err := fdnotifier.AddFD(int32(u.listenFD), &u.queue); err != nil {
+		log.Warningf("vsock: not accepting connections from the host: %v", err)
+		return
+	}
+	go u.accept(s) // S/R-SAFE: vsock sockets prevent saving.
+}
+
+// accept accepts connections from the host until listenFD fails.
+func (u *UDSTransport) accept(s *Stack) {
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	u.queue.EventRegister(&e)
+	defer u.queue.EventUnregister(&e)
+	if err := fdnotifier.UpdateFD(int32(u.listenFD)); err != nil {
+		log.Warningf("vsock: not accepting connections from the host: %v", err)
+		return
+	}
+	for {
+		fd, _, err := unix.Accept4(u.listenFD, unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
+		switch err {
+		case nil:
+			go u.handshake(s, fd) // S/R-SAFE: vsock sockets prevent saving.
+		case unix.EAGAIN:
+			<-ch
+		case unix.EINTR, unix.ECONNABORTED:
+		default:
+			log.Warningf("vsock: no longer accepting connections from the host: %v", err)
+			return
+		}
+	}
+}
+
+// handshake completes the CONNECT request of a connection from the host and
+// delivers it to s. The connection is closed if the request is invalid or no
+// socket is listening on the requested port.
+func (u *UDSTransport) handshake(s *Stack, fd int) {
+	port, err := readRequest(fd)
+	if err == nil {
+		err = s.Deliver(port, fd, func(hostPort uint32) error {
+			return writeReply(fd, hostPort)
+		})
+	}
+	if err != nil {
+		log.Debugf("vsock: rejecting connection from the host: %v", err)
+		_ = unix.Close(fd)
+	}
+}
+
+// readRequest reads a CONNECT request from the non-blocking socket fd and
+// returns the requested port. It reads one byte at a time so that data sent
+// after the request stays in the socket.
+func readRequest(fd int) (uint32, error) {
+	var q waiter.Queue
+	if err := fdnotifier.AddFD(int32(fd), &q); err != nil {
+		return 0, err
+	}
+	defer fdnotifier.RemoveFD(int32(fd))
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	q.EventRegister(&e)
+	defer q.EventUnregister(&e)
+	if err := fdnotifier.UpdateFD(int32(fd)); err != nil {
+		return 0, err
+	}
+
+	timeout := time.NewTimer(handshakeTimeout)
+	defer timeout.Stop()
+	var req []byte
+	b := make([]byte, 1)
+	for len(req) < maxRequestLen {
+		n, err := unix.Read(fd, b)
+		switch {
+		case err == unix.EAGAIN:
+			select {
+			case <-ch:
+			case <-timeout.C:
+				return 0, fmt.Errorf("timed out waiting for CONNECT request")
+			}
+			continue
+		case err == unix.EINTR:
+			continue
+		case err != nil:
+			return 0, err
+		case n == 0:
+			return 0, fmt.Errorf("EOF before end of CONNECT request %q", req)
+		}
+		if b[0] == '\n' {
+			return parseRequest(string(req))
+		}
+		req = append(req, b[0])
+	}
+	return 0, fmt.Errorf("CONNECT request %q is too long", req)
+}
+
+// parseRequest parses a CONNECT request without its trailing newline.
+func parseRequest(req string) (uint32, error) {
+	fields := strings.Fields(req)
+	if len(fields) != 2 || fields[0] != "CONNECT" {
+		return 0, fmt.Errorf("invalid CONNECT request %q", req)
+	}
+	port, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port in CONNECT request %q: %w", req, err)
+	}
+	return uint32(port), nil
+}
+
+// writeReply acknowledges a CONNECT request on fd.
+func writeReply(fd int, hostPort uint32) error {
+	reply := []byte(fmt.Sprintf("OK %d\n", hostPort))
+	for len(reply) > 0 {
+		n, err := unix.Write(fd, reply)
+		if err != nil {
+			return err
+		}
+		reply = reply[n:]
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsock
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseRequest(t *testing.T) {
+	for _, tc := range []struct {
+		req     string
+		want    uint32
+		wantErr bool
+	}{
+		{req: "CONNECT 52", want: 52},
+		{req: "CONNECT 4294967295", want: 4294967295},
+		{req: "CONNECT  1024 ", want: 1024},
+		{req: "CONNECT", wantErr: true},
+		{req: "CONNECT 4294967296", wantErr: true},
+		{req: "CONNECT -1", wantErr: true},
+		{req: "CONNECT 52 53", wantErr: true},
+		{req: "OK 52", wantErr: true},
+		{req: "", wantErr: true},
+	} {
+		t.Run(tc.req, func(t *testing.T) {
+			got, err := parseRequest(tc.req)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parseRequest(%q) = %d, want error", tc.req, got)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("parseRequest(%q) = %d, %v, want %d, nil", tc.req, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestUDSTransportConnect(t *testing.T) {
+	dir := t.TempDir()
+	l, err := net.Listen("unix", filepath.Join(dir, "v.sock_52"))
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer l.Close()
+
+	dirFD, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("open(%q): %v", dir, err)
+	}
+	defer unix.Close(dirFD)
+	u, err := NewUDSTransport(-1, dirFD, "v.sock")
+	if err != nil {
+		t.Fatalf("NewUDSTransport: %v", err)
+	}
+
+	fd, err := u.Connect(52)
+	if err != nil {
+		t.Fatalf("Connect(52): %v", err)
+	}
+	f := os.NewFile(uintptr(fd), "vsock")
+	defer f.Close()
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("x")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	pfds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	if _, err := unix.Poll(pfds, 5000 /* ms */); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	b := make([]byte, 1)
+	if n, err := unix.Read(fd, b); err != nil || n != 1 || b[0] != 'x' {
+		t.Errorf("Read got (%d, %v) and %q, want (1, nil) and %q", n, err, b[:n], "x")
+	}
+
+	if fd, err := u.Connect(53); err != unix.ENOENT {
+		if err == nil {
+			unix.Close(fd)
+		}
+		t.Errorf("Connect(53) got error %v, want %v", err, unix.ENOENT)
+	}
+}
+
+func TestNewUDSTransportNameTooLong(t *testing.T) {
+	name := make([]byte, unix.PathMax)
+	for i := range name {
+		name[i] = 'a'
+	}
+	if _, err := NewUDSTransport(-1, 3, string(name)); err == nil {
+		t.Errorf("NewUDSTransport with a %d byte name succeeded, want error", len(name))
+	}
+}
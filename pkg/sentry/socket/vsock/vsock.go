@@ -0,0 +1,180 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vsock implements AF_VSOCK stream sockets.
+//
+// The sandbox is assigned a single context ID (CID). Connections to the
+// sandbox's own CID are looped back within the sentry, and connections to and
+// from the host's CID are carried by a Transport.
+package vsock
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+const (
+	// lastReservedPort is the last port that can only be bound with
+	// CAP_NET_BIND_SERVICE, from net/vmw_vsock/af_vsock.c.
+	lastReservedPort = 1023
+
+	// firstHostPort is the first port assigned to connections initiated by
+	// the host. It matches the ports assigned by Firecracker, so that they
+	// don't collide with ports bound on the host.
+	firstHostPort = 1 << 30
+)
+
+// Transport carries connections between the sandbox and the host.
+type Transport interface {
+	// Connect returns a non-blocking host stream socket connected to port on
+	// the host.
+	Connect(port uint32) (int, error)
+
+	// Serve starts delivering the connections initiated by the host to s
+	// through Stack.Deliver. It doesn't block.
+	Serve(s *Stack)
+}
+
+// Stack holds the vsock ports of the sandbox.
+type Stack struct {
+	cid       uint32
+	transport Transport
+
+	mu sync.Mutex
+
+	// ports maps bound local ports to their sockets.
+	//
+	// +checklocks:mu
+	ports map[uint32]*socketVFS2
+
+	// nextPort is the next ephemeral local port to try.
+	//
+	// +checklocks:mu
+	nextPort uint32
+
+	// nextHostPort is the port assigned to the next connection initiated by
+	// the host.
+	//
+	// +checklocks:mu
+	nextHostPort uint32
+}
+
+// NewStack returns a Stack for a sandbox with the given CID. transport may be
+// nil, in which case only connections within the sandbox are possible.
+func NewStack(cid uint32, transport Transport) *Stack {
+	return &Stack{
+		cid:          cid,
+		transport:    transport,
+		ports:        make(map[uint32]*socketVFS2),
+		nextPort:     lastReservedPort + 1,
+		nextHostPort: firstHostPort,
+	}
+}
+
+// Register makes AF_VSOCK sockets backed by s available to the sandbox, and
+// starts accepting connections from the host.
+//
+// This should only be called once, before the sandbox starts.
+func Register(s *Stack) {
+	socket.RegisterProviderVFS2(linux.AF_VSOCK, &provider{stack: s})
+	if s.transport != nil {
+		s.transport.Serve(s)
+	}
+}
+
+// CID returns the sandbox's CID.
+func (s *Stack) CID() uint32 {
+	return s.cid
+}
+
+// isLocal returns true if cid addresses the sandbox itself.
+func (s *Stack) isLocal(cid uint32) bool {
+	return cid == s.cid || cid == linux.VMADDR_CID_LOCAL
+}
+
+// bind binds ep to port, or to an ephemeral port if port is VMADDR_PORT_ANY,
+// and returns the bound port.
+func (s *Stack) bind(ep *socketVFS2, port uint32) (uint32, *syserr.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if port != linux.VMADDR_PORT_ANY {
+		if _, ok := s.ports[port]; ok {
+			return 0, syserr.ErrAddressInUse
+		}
+		s.ports[port] = ep
+		return port, nil
+	}
+	for i := uint32(0); i < linux.VMADDR_PORT_ANY-lastReservedPort-1; i++ {
+		port := s.nextPort
+		s.nextPort++
+		if s.nextPort == linux.VMADDR_PORT_ANY {
+			s.nextPort = lastReservedPort + 1
+		}
+		if _, ok := s.ports[port]; !ok {
+			s.ports[port] = ep
+			return port, nil
+		}
+	}
+	return 0, syserr.ErrAddressInUse
+}
+
+// unbind releases port, which must have been bound by ep.
+func (s *Stack) unbind(ep *socketVFS2, port uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ports[port] == ep {
+		delete(s.ports, port)
+	}
+}
+
+// enqueue queues the connection carried by fd, coming from peer, on the
+// socket listening on port. If ack isn't nil, it is called before the
+// connection becomes visible to the listener. On success, the listener takes
+// ownership of fd.
+func (s *Stack) enqueue(port uint32, fd int, peer linux.SockAddrVM, ack func() error) *syserr.Error {
+	// Sockets lock the Stack while they are locked, so the listener must be
+	// locked after the Stack is unlocked. If the listener is closed in
+	// between, it rejects the connection.
+	s.mu.Lock()
+	ep, ok := s.ports[port]
+	s.mu.Unlock()
+	if !ok {
+		return syserr.ErrConnectionReset
+	}
+	return ep.enqueue(fd, peer, ack)
+}
+
+// Deliver queues a connection initiated by the host on the socket listening
+// on port. ack is called with the port assigned to the host's end of the
+// connection before the connection becomes visible to the listener, and may
+// be used to complete the transport's handshake. On success, the Stack takes
+// ownership of fd; otherwise, the caller should reset the connection.
+func (s *Stack) Deliver(port uint32, fd int, ack func(hostPort uint32) error) error {
+	s.mu.Lock()
+	hostPort := s.nextHostPort
+	s.nextHostPort++
+	s.mu.Unlock()
+
+	peer := linux.SockAddrVM{
+		Family: linux.AF_VSOCK,
+		Port:   hostPort,
+		CID:    linux.VMADDR_CID_HOST,
+	}
+	if err := s.enqueue(port, fd, peer, func() error { return ack(hostPort) }); err != nil {
+		return err.ToError()
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// A live migration connection begins with migrationMagic and
+// migrationVersion, sent by the source. The destination replies with a
+// result (see ReplyMigration) once it is ready to receive the migration.
+//
+// The source then sends a sequence of frames, each consisting of a
+// frameHeaderSize-byte header (the frame kind, an offset and a length, in
+// little-endian byte order) followed by length bytes of data:
+//
+//   - framePages frames contain the contents of memory at the given offset in
+//     the pages file. These are sent while the sandbox is running (pre-copy),
+//     and again for pages that changed after being sent (stop-and-copy).
+//
+//   - frameState frames contain consecutive chunks of the state file, which is
+//     sent during stop-and-copy.
+//
+//   - A frameDone frame ends the sequence.
+//
+// Finally, the destination restores the sandbox and replies with a second
+// result. The source exits if it succeeded, and resumes otherwise.
+const (
+	migrationMagic   = "gVisorLM"
+	migrationVersion = 1
+
+	frameHeaderSize = 17
+)
+
+// Frame kinds.
+const (
+	framePages byte = iota + 1
+	frameState
+	frameDone
+)
+
+// migrationBufferSize is the size of buffers used to send and receive frames.
+const migrationBufferSize = 1 << 20
+
+// MigrateOpts contains live migration options.
+type MigrateOpts struct {
+	// Conn is the connection to the destination, which must be accepting a
+	// live migration with AcceptMigration.
+	Conn io.ReadWriter
+
+	// Key is used for state integrity check.
+	Key []byte
+
+	// Metadata is save metadata.
+	Metadata map[string]string
+
+	// MaxRounds is the maximum number of pre-copy rounds, in which memory is
+	// copied while the sandbox is running.
+	MaxRounds int
+
+	// DirtyThreshold ends pre-copy early once a round copies at most
+	// DirtyThreshold bytes of memory.
+	DirtyThreshold uint64
+
+	// Callback is called prior to unpause, with any migration error. If it is
+	// called with a nil error, the sandbox has been restored on the
+	// destination.
+	Callback func(err error)
+}
+
+// PrecopyRound describes a pre-copy round of a live migration.
+type PrecopyRound struct {
+	// Bytes is the number of bytes of memory copied.
+	Bytes uint64 `json:"bytes"`
+
+	// Duration is the duration of the round.
+	Duration time.Duration `json:"duration"`
+}
+
+// MigrationStats contains the durations of the phases of a live migration.
+type MigrationStats struct {
+	// Precopy describes each pre-copy round.
+	Precopy []PrecopyRound `json:"precopy"`
+
+	// StopAndCopy is the time from pausing the sandbox until its state and
+	// the rest of its memory were sent.
+	StopAndCopy time.Duration `json:"stop_and_copy"`
+
+	// StopAndCopyBytes is the number of bytes of memory sent during
+	// stop-and-copy.
+	StopAndCopyBytes uint64 `json:"stop_and_copy_bytes"`
+
+	// Restore is the time taken to restore the sandbox on the destination,
+	// as reported by the destination.
+	Restore time.Duration `json:"restore"`
+
+	// Downtime is the time from pausing the sandbox until it was restored on
+	// the destination.
+	Downtime time.Duration `json:"downtime"`
+}
+
+// Migrate migrates the system to the destination. Memory is copied to the
+// destination while the system is running, until a round of pre-copy copies
+// little enough memory or opts.MaxRounds is reached, then the system is paused
+// and its state is saved to the destination. Migrate returns once the
+// destination has restored the state, or failed to.
+func (opts MigrateOpts) Migrate(ctx context.Context, k *kernel.Kernel, w *watchdog.Watchdog) (MigrationStats, error) {
+	var stats MigrationStats
+	if err := startMigration(opts.Conn); err != nil {
+		return stats, err
+	}
+	mw := &migrationWriter{w: bufio.NewWriterSize(opts.Conn, migrationBufferSize)}
+
+	log.Infof("Live migration pre-copy started.")
+	tracker := k.MemoryFile().TrackDirty()
+	for i := 0; i < opts.MaxRounds; i++ {
+		start := time.Now()
+		n, err := tracker.Copy(mw)
+		if err == nil {
+			err = mw.flush()
+		}
+		if err != nil {
+			return stats, fmt.Errorf("pre-copy round %d: %w", i+1, err)
+		}
+		round := PrecopyRound{
+			Bytes:    n,
+			Duration: time.Since(start),
+		}
+		stats.Precopy = append(stats.Precopy, round)
+		log.Infof("Live migration pre-copy round %d copied %d bytes in [%s].", i+1, round.Bytes, round.Duration)
+		if n <= opts.DirtyThreshold {
+			break
+		}
+	}
+
+	var (
+		start      time.Time
+		migrateErr error
+	)
+	precopied := mw.pagesBytes()
+	saveOpts := SaveOpts{
+		Destination: migrationStateWriter{mw},
+		PagesFileAt: mw,
+		Precopied:   tracker,
+		Key:         opts.Key,
+		Metadata:    opts.Metadata,
+		Callback: func(err error) {
+			if err == nil {
+				err = mw.done()
+			}
+			stats.StopAndCopy = time.Since(start)
+			stats.StopAndCopyBytes = mw.pagesBytes() - precopied
+			if err == nil {
+				stats.Restore, err = readMigrationResult(opts.Conn)
+			}
+			stats.Downtime = time.Since(start)
+			if err == nil {
+				log.Infof("Live migration downtime was [%s]: stop-and-copy took [%s] for %d bytes of memory, restore took [%s].", stats.Downtime, stats.StopAndCopy, stats.StopAndCopyBytes, stats.Restore)
+			}
+			migrateErr = err
+			opts.Callback(err)
+		},
+	}
+	start = time.Now()
+	if err := saveOpts.Save(ctx, k, w); err != nil {
+		return stats, err
+	}
+	return stats, migrateErr
+}
+
+// startMigration starts a live migration on conn, and waits for the
+// destination to be ready.
+func startMigration(conn io.ReadWriter) error {
+	var hello [len(migrationMagic) + 4]byte
+	copy(hello[:], migrationMagic)
+	binary.LittleEndian.PutUint32(hello[len(migrationMagic):], migrationVersion)
+	if _, err := conn.Write(hello[:]); err != nil {
+		return fmt.Errorf("starting live migration: %w", err)
+	}
+	if _, err := readMigrationResult(conn); err != nil {
+		return fmt.Errorf("starting live migration: %w", err)
+	}
+	return nil
+}
+
+// AcceptMigration accepts a live migration started on conn by
+// MigrateOpts.Migrate, and tells the source that the destination is ready to
+// receive it.
+func AcceptMigration(conn io.ReadWriter) error {
+	var hello [len(migrationMagic) + 4]byte
+	if _, err := io.ReadFull(conn, hello[:]); err != nil {
+		return fmt.Errorf("reading live migration header: %w", err)
+	}
+	var err error
+	if string(hello[:len(migrationMagic)]) != migrationMagic {
+		err = errors.New("not a live migration")
+	} else if v := binary.LittleEndian.Uint32(hello[len(migrationMagic):]); v != migrationVersion {
+		err = fmt.Errorf("unsupported live migration version %d, expected %d", v, migrationVersion)
+	}
+	if replyErr := ReplyMigration(conn, 0, err); err == nil {
+		err = replyErr
+	}
+	return err
+}
+
+// ReceiveMigration receives the state file and contents of memory sent by the
+// source of a live migration accepted by AcceptMigration. The contents of
+// memory are written to pagesFile, which must be initially empty. It returns
+// the number of bytes of memory received.
+func ReceiveMigration(conn io.Reader, stateFile io.Writer, pagesFile io.WriterAt) (uint64, error) {
+	r := bufio.NewReaderSize(conn, migrationBufferSize)
+	buf := make([]byte, migrationBufferSize)
+	var received uint64
+	for {
+		var hdr [frameHeaderSize]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return received, fmt.Errorf("reading live migration frame: %w", err)
+		}
+		kind := hdr[0]
+		off := binary.LittleEndian.Uint64(hdr[1:])
+		length := binary.LittleEndian.Uint64(hdr[9:])
+		switch kind {
+		case framePages, frameState:
+		case frameDone:
+			return received, nil
+		default:
+			return received, fmt.Errorf("unknown live migration frame kind %d", kind)
+		}
+		for length > 0 {
+			n := uint64(len(buf))
+			if n > length {
+				n = length
+			}
+			if _, err := io.ReadFull(r, buf[:n]); err != nil {
+				return received, fmt.Errorf("reading live migration frame: %w", err)
+			}
+			var err error
+			if kind == framePages {
+				_, err = pagesFile.WriteAt(buf[:n], int64(off))
+				received += n
+			} else {
+				_, err = stateFile.Write(buf[:n])
+			}
+			if err != nil {
+				return received, err
+			}
+			off += n
+			length -= n
+		}
+	}
+}
+
+// ReplyMigration tells the source of a live migration whether restoring it on
+// the destination succeeded, so that the source exits or resumes
+// respectively. d is the time taken to restore.
+func ReplyMigration(conn io.Writer, d time.Duration, err error) error {
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+	reply := make([]byte, 12+len(msg))
+	binary.LittleEndian.PutUint64(reply, uint64(d))
+	binary.LittleEndian.PutUint32(reply[8:], uint32(len(msg)))
+	copy(reply[12:], msg)
+	_, writeErr := conn.Write(reply)
+	return writeErr
+}
+
+// readMigrationResult reads a reply written by ReplyMigration.
+func readMigrationResult(conn io.Reader) (time.Duration, error) {
+	var reply [12]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return 0, fmt.Errorf("reading live migration result: %w", err)
+	}
+	d := time.Duration(binary.LittleEndian.Uint64(reply[:]))
+	if n := binary.LittleEndian.Uint32(reply[8:]); n != 0 {
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return 0, fmt.Errorf("reading live migration result: %w", err)
+		}
+		return d, fmt.Errorf("destination: %s", msg)
+	}
+	return d, nil
+}
+
+// migrationWriter writes frames to a live migration connection. The
+// contents of memory are written by WriteAt.
+type migrationWriter struct {
+	// mu serializes frames, which may be written concurrently by the state
+	// file writer.
+	mu sync.Mutex
+
+	// w is the buffered connection. w is protected by mu.
+	w *bufio.Writer
+
+	// pages is the number of bytes of memory written. pages is protected by
+	// mu.
+	pages uint64
+}
+
+// writeFrame writes a frame of the given kind.
+func (mw *migrationWriter) writeFrame(kind byte, off uint64, data []byte) error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	var hdr [frameHeaderSize]byte
+	hdr[0] = kind
+	binary.LittleEndian.PutUint64(hdr[1:], off)
+	binary.LittleEndian.PutUint64(hdr[9:], uint64(len(data)))
+	if _, err := mw.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := mw.w.Write(data); err != nil {
+		return err
+	}
+	if kind == framePages {
+		mw.pages += uint64(len(data))
+	}
+	return nil
+}
+
+// WriteAt implements io.WriterAt.WriteAt.
+func (mw *migrationWriter) WriteAt(p []byte, off int64) (int, error) {
+	if err := mw.writeFrame(framePages, uint64(off), p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// pagesBytes returns the number of bytes of memory written.
+func (mw *migrationWriter) pagesBytes() uint64 {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	return mw.pages
+}
+
+// flush sends all buffered frames.
+func (mw *migrationWriter) flush() error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	return mw.w.Flush()
+}
+
+// done ends the sequence of frames.
+func (mw *migrationWriter) done() error {
+	if err := mw.writeFrame(frameDone, 0, nil); err != nil {
+		return err
+	}
+	return mw.flush()
+}
+
+// migrationStateWriter writes the state file to a live migration connection.
+type migrationStateWriter struct {
+	*migrationWriter
+}
+
+// Write implements io.Writer.Write.
+func (sw migrationStateWriter) Write(p []byte) (int, error) {
+	if err := sw.writeFrame(frameState, 0, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
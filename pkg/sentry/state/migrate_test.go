@@ -0,0 +1,121 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pagesBuffer is an io.WriterAt backed by a byte slice.
+type pagesBuffer []byte
+
+// WriteAt implements io.WriterAt.WriteAt.
+func (b *pagesBuffer) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(*b) {
+		*b = append(*b, make([]byte, end-len(*b))...)
+	}
+	return copy((*b)[off:], p), nil
+}
+
+func TestMigrationProtocol(t *testing.T) {
+	src, dst := net.Pipe()
+	defer src.Close()
+	defer dst.Close()
+
+	var (
+		state bytes.Buffer
+		pages pagesBuffer
+	)
+	errCh := make(chan error, 1)
+	go func() {
+		if err := AcceptMigration(dst); err != nil {
+			errCh <- err
+			return
+		}
+		if _, err := ReceiveMigration(dst, &state, &pages); err != nil {
+			errCh <- err
+			return
+		}
+		errCh <- ReplyMigration(dst, time.Second, nil)
+	}()
+
+	if err := startMigration(src); err != nil {
+		t.Fatalf("startMigration failed: %v", err)
+	}
+	mw := &migrationWriter{w: bufio.NewWriter(src)}
+	if _, err := mw.WriteAt([]byte("world"), 6); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if _, err := (migrationStateWriter{mw}).Write([]byte("state")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := mw.WriteAt([]byte("hello "), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if err := mw.done(); err != nil {
+		t.Fatalf("done failed: %v", err)
+	}
+	d, err := readMigrationResult(src)
+	if err != nil {
+		t.Fatalf("readMigrationResult failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("destination failed: %v", err)
+	}
+
+	if d != time.Second {
+		t.Errorf("got restore duration %v, want %v", d, time.Second)
+	}
+	if got, want := mw.pagesBytes(), uint64(11); got != want {
+		t.Errorf("got %d bytes of pages sent, want %d", got, want)
+	}
+	if got, want := string(pages), "hello world"; got != want {
+		t.Errorf("got pages %q, want %q", got, want)
+	}
+	if got, want := state.String(), "state"; got != want {
+		t.Errorf("got state %q, want %q", got, want)
+	}
+}
+
+func TestMigrationRestoreFailed(t *testing.T) {
+	src, dst := net.Pipe()
+	defer src.Close()
+	defer dst.Close()
+
+	go ReplyMigration(dst, 0, errors.New("restore failed"))
+	if _, err := readMigrationResult(src); err == nil || !strings.Contains(err.Error(), "restore failed") {
+		t.Errorf("readMigrationResult got error %v, want restore failure", err)
+	}
+}
+
+func TestMigrationBadHeader(t *testing.T) {
+	src, dst := net.Pipe()
+	defer src.Close()
+	defer dst.Close()
+
+	go func() {
+		src.Write([]byte("notLMxxxxxxx"))
+		readMigrationResult(src)
+	}()
+	if err := AcceptMigration(dst); err == nil {
+		t.Errorf("AcceptMigration succeeded with a bad header, want error")
+	}
+}
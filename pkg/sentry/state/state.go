@@ -18,16 +18,19 @@ package state
 import (
 	"fmt"
 	"io"
+	"os"
 
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
 	"gvisor.dev/gvisor/pkg/state/statefile"
+	"gvisor.dev/gvisor/pkg/state/wire"
 )
 
 var previousMetadata map[string]string
@@ -48,9 +51,28 @@ type SaveOpts struct {
 	// Destination is the save target.
 	Destination io.Writer
 
+	// PagesFile is an optional save target for the contents of memory. If it
+	// is set, memory can be loaded lazily on restore.
+	PagesFile io.Writer
+
+	// PagesFileAt is like PagesFile, but the contents of memory are written
+	// to it at their offsets in the MemoryFile. See
+	// pgalloc.SaveOpts.PagesFileAt.
+	PagesFileAt io.WriterAt
+
+	// Precopied, if set, tracks the contents of memory that were already
+	// written to PagesFileAt before the save. See pgalloc.SaveOpts.Precopied.
+	Precopied *pgalloc.DirtyTracker
+
 	// Key is used for state integrity check.
 	Key []byte
 
+	// EncryptionKey, if set, is used to encrypt and authenticate the state
+	// instead of Key. It must be statefile.EncryptionKeySize bytes long, and
+	// PagesFile must not be set, since the contents of memory are then only
+	// protected if they are saved inline.
+	EncryptionKey []byte
+
 	// Metadata is save metadata.
 	Metadata map[string]string
 
@@ -78,12 +100,28 @@ func (opts SaveOpts) Save(ctx context.Context, k *kernel.Kernel, w *watchdog.Wat
 	addSaveMetadata(opts.Metadata)
 
 	// Open the statefile.
-	wc, err := statefile.NewWriter(opts.Destination, opts.Key, opts.Metadata)
+	var (
+		wc  statefile.WriteCloser
+		err error
+	)
+	if opts.EncryptionKey != nil {
+		if opts.PagesFile != nil || opts.PagesFileAt != nil {
+			err = fmt.Errorf("the contents of memory can't be saved to a separate pages file when encrypting state")
+		} else {
+			wc, err = statefile.NewEncryptedWriter(opts.Destination, opts.EncryptionKey, opts.Metadata)
+		}
+	} else {
+		wc, err = statefile.NewWriter(opts.Destination, opts.Key, opts.Metadata)
+	}
 	if err != nil {
 		err = ErrStateFile{err}
 	} else {
 		// Save the kernel.
-		err = k.SaveTo(ctx, wc)
+		err = k.SaveTo(ctx, wc, pgalloc.SaveOpts{
+			PagesFile:   opts.PagesFile,
+			PagesFileAt: opts.PagesFileAt,
+			Precopied:   opts.Precopied,
+		})
 
 		// ENOSPC is a state file error. This error can only come from
 		// writing the state file, and not from fs.FileOperations.Fsync
@@ -107,18 +145,49 @@ type LoadOpts struct {
 
 	// Key is used for state integrity check.
 	Key []byte
+
+	// EncryptionKey, if set, is the key that the state was encrypted with
+	// and is used instead of Key. State that isn't encrypted can still be
+	// loaded, without any integrity check.
+	EncryptionKey []byte
+
+	// PagesFile is the load source for the contents of memory, if it was
+	// saved separately. Load takes ownership of PagesFile.
+	PagesFile *os.File
+
+	// If LazyPages is true, the contents of memory are loaded from PagesFile
+	// on demand after Load returns.
+	LazyPages bool
 }
 
 // Load loads the given kernel, setting the provided platform and stack.
 func (opts LoadOpts) Load(ctx context.Context, k *kernel.Kernel, timeReady chan struct{}, n inet.Stack, clocks time.Clocks, vfsOpts *vfs.CompleteRestoreOptions) error {
 	// Open the file.
-	r, m, err := statefile.NewReader(opts.Source, opts.Key)
+	var (
+		r   wire.Reader
+		m   map[string]string
+		err error
+	)
+	if opts.EncryptionKey != nil {
+		var encrypted bool
+		r, m, encrypted, err = statefile.NewEncryptedReader(opts.Source, opts.EncryptionKey)
+		if err == nil && !encrypted {
+			log.Warningf("Statefile is not encrypted, loading it without an integrity check")
+		} else if err == nil && opts.PagesFile != nil {
+			err = fmt.Errorf("encrypted state can't be loaded with a separate pages file")
+		}
+	} else {
+		r, m, err = statefile.NewReader(opts.Source, opts.Key)
+	}
 	if err != nil {
+		if opts.PagesFile != nil {
+			opts.PagesFile.Close()
+		}
 		return ErrStateFile{err}
 	}
 
 	previousMetadata = m
 
 	// Restore the Kernel object graph.
-	return k.LoadFrom(ctx, r, timeReady, n, clocks, vfsOpts)
+	return k.LoadFrom(ctx, r, pgalloc.LoadOpts{PagesFile: opts.PagesFile, Lazy: opts.LazyPages}, timeReady, n, clocks, vfsOpts)
 }
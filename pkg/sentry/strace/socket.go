@@ -361,6 +361,13 @@ func sockAddr(t *kernel.Task, addr hostarch.Addr, length uint32) string {
 			return fmt.Sprintf("%#x {Family: %s, error extracting address: %v}", addr, familyStr, err)
 		}
 		return fmt.Sprintf("%#x {Family: %s, PortID: %d, Groups: %d}", addr, familyStr, sa.PortID, sa.Groups)
+	case linux.AF_VSOCK:
+		if len(b) < linux.SockAddrVMSize {
+			return fmt.Sprintf("%#x {Family: %s, error extracting address: too short}", addr, familyStr)
+		}
+		var sa linux.SockAddrVM
+		sa.UnmarshalUnsafe(b[:linux.SockAddrVMSize])
+		return fmt.Sprintf("%#x {Family: %s, CID: %d, Port: %d}", addr, familyStr, sa.CID, sa.Port)
 	default:
 		return fmt.Sprintf("%#x {Family: %s, family addr format unknown}", addr, familyStr)
 	}
@@ -538,12 +545,15 @@ var sockOptNames = map[uint64]abi.ValueSet{
 		linux.SO_REUSEPORT:    "SO_REUSEPORT",
 		linux.SO_BINDTODEVICE: "SO_BINDTODEVICE",
 		linux.SO_BROADCAST:    "SO_BROADCAST",
+		linux.SO_BUSY_POLL:    "SO_BUSY_POLL",
 		linux.SO_KEEPALIVE:    "SO_KEEPALIVE",
 		linux.SO_LINGER:       "SO_LINGER",
 		linux.SO_SNDTIMEO:     "SO_SNDTIMEO",
 		linux.SO_RCVTIMEO:     "SO_RCVTIMEO",
 		linux.SO_OOBINLINE:    "SO_OOBINLINE",
 		linux.SO_TIMESTAMP:    "SO_TIMESTAMP",
+		linux.SO_TIMESTAMPING: "SO_TIMESTAMPING",
+		linux.SO_ZEROCOPY:     "SO_ZEROCOPY",
 	},
 	linux.SOL_TCP: {
 		linux.TCP_NODELAY:              "TCP_NODELAY",
@@ -54,7 +54,7 @@ var AMD64 = &kernel.SyscallTable{
 	Table: map[uintptr]kernel.Syscall{
 		0:   syscalls.SupportedPoint("read", Read, PointRead),
 		1:   syscalls.Supported("write", Write),
-		2:   syscalls.PartiallySupportedPoint("open", Open, PointOpen, "Options O_DIRECT, O_NOATIME, O_PATH, O_TMPFILE, O_SYNC are not supported.", nil),
+		2:   syscalls.PartiallySupportedPoint("open", Open, PointOpen, "Options O_DIRECT, O_NOATIME, O_PATH, O_SYNC are not supported. O_TMPFILE is only supported on gofer mounts.", nil),
 		3:   syscalls.Supported("close", Close),
 		4:   syscalls.Supported("stat", Stat),
 		5:   syscalls.Supported("fstat", Fstat),
@@ -79,8 +79,8 @@ var AMD64 = &kernel.SyscallTable{
 		24:  syscalls.Supported("sched_yield", SchedYield),
 		25:  syscalls.Supported("mremap", Mremap),
 		26:  syscalls.PartiallySupported("msync", Msync, "Full data flush is not guaranteed at this time.", nil),
-		27:  syscalls.PartiallySupported("mincore", Mincore, "Stub implementation. The sandbox does not have access to this information. Reports all mapped pages are resident.", nil),
-		28:  syscalls.PartiallySupported("madvise", Madvise, "Options MADV_DONTNEED, MADV_DONTFORK are supported. Other advice is ignored.", nil),
+		27:  syscalls.PartiallySupported("mincore", Mincore, "Pages of files cached in sentry memory are reported as for cachestat(2); all other mapped pages are reported resident.", nil),
+		28:  syscalls.PartiallySupported("madvise", Madvise, "Options MADV_DONTNEED, MADV_DONTFORK, MADV_COLD and MADV_PAGEOUT are supported. Other advice is ignored.", nil),
 		29:  syscalls.PartiallySupported("shmget", Shmget, "Option SHM_HUGETLB is not supported.", nil),
 		30:  syscalls.PartiallySupported("shmat", Shmat, "Option SHM_RND is not supported.", nil),
 		31:  syscalls.PartiallySupported("shmctl", Shmctl, "Options SHM_LOCK, SHM_UNLOCK are not supported.", nil),
@@ -153,7 +153,7 @@ var AMD64 = &kernel.SyscallTable{
 		98:  syscalls.PartiallySupported("getrusage", Getrusage, "Fields ru_maxrss, ru_minflt, ru_majflt, ru_inblock, ru_oublock are not supported. Fields ru_utime and ru_stime have low precision.", nil),
 		99:  syscalls.PartiallySupported("sysinfo", Sysinfo, "Fields loads, sharedram, bufferram, totalswap, freeswap, totalhigh, freehigh not supported.", nil),
 		100: syscalls.Supported("times", Times),
-		101: syscalls.PartiallySupported("ptrace", Ptrace, "Options PTRACE_PEEKSIGINFO, PTRACE_SECCOMP_GET_FILTER not supported.", nil),
+		101: syscalls.PartiallySupported("ptrace", Ptrace, "Option PTRACE_SECCOMP_GET_FILTER not supported.", nil),
 		102: syscalls.Supported("getuid", Getuid),
 		103: syscalls.PartiallySupported("syslog", Syslog, "Outputs a dummy message for security reasons.", nil),
 		104: syscalls.Supported("getgid", Getgid),
@@ -187,7 +187,7 @@ var AMD64 = &kernel.SyscallTable{
 		132: syscalls.Supported("utime", Utime),
 		133: syscalls.PartiallySupported("mknod", Mknod, "Device creation is not generally supported. Only regular file and FIFO creation are supported.", nil),
 		134: syscalls.Error("uselib", linuxerr.ENOSYS, "Obsolete", nil),
-		135: syscalls.ErrorWithEvent("personality", linuxerr.EINVAL, "Unable to change personality.", nil),
+		135: syscalls.PartiallySupported("personality", Personality, "Only the PER_LINUX32 execution domain has an effect, and personality flags are ignored.", nil),
 		136: syscalls.ErrorWithEvent("ustat", linuxerr.ENOSYS, "Needs filesystem support.", nil),
 		137: syscalls.PartiallySupported("statfs", Statfs, "Depends on the backing file system implementation.", nil),
 		138: syscalls.PartiallySupported("fstatfs", Fstatfs, "Depends on the backing file system implementation.", nil),
@@ -216,7 +216,7 @@ var AMD64 = &kernel.SyscallTable{
 		161: syscalls.SupportedPoint("chroot", Chroot, PointChroot),
 		162: syscalls.PartiallySupported("sync", Sync, "Full data flush is not guaranteed at this time.", nil),
 		163: syscalls.CapError("acct", linux.CAP_SYS_PACCT, "", nil),
-		164: syscalls.CapError("settimeofday", linux.CAP_SYS_TIME, "", nil),
+		164: syscalls.PartiallySupported("settimeofday", Settimeofday, "Only the sandbox's clock is set. The timezone can't be changed.", nil),
 		165: syscalls.PartiallySupported("mount", Mount, "Not all options or file systems are supported.", nil),
 		166: syscalls.PartiallySupported("umount2", Umount2, "Not all options or file systems are supported.", nil),
 		167: syscalls.CapError("swapon", linux.CAP_SYS_ADMIN, "", nil),
@@ -279,7 +279,7 @@ var AMD64 = &kernel.SyscallTable{
 		224: syscalls.Supported("timer_gettime", TimerGettime),
 		225: syscalls.Supported("timer_getoverrun", TimerGetoverrun),
 		226: syscalls.Supported("timer_delete", TimerDelete),
-		227: syscalls.Supported("clock_settime", ClockSettime),
+		227: syscalls.PartiallySupported("clock_settime", ClockSettime, "Only CLOCK_REALTIME can be set, and only in the sandbox.", nil),
 		228: syscalls.Supported("clock_gettime", ClockGettime),
 		229: syscalls.Supported("clock_getres", ClockGetres),
 		230: syscalls.Supported("clock_nanosleep", ClockNanosleep),
@@ -300,9 +300,9 @@ var AMD64 = &kernel.SyscallTable{
 		245: syscalls.ErrorWithEvent("mq_getsetattr", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}),   // TODO(b/29354921)
 		246: syscalls.CapError("kexec_load", linux.CAP_SYS_BOOT, "", nil),
 		247: syscalls.Supported("waitid", Waitid),
-		248: syscalls.Error("add_key", linuxerr.EACCES, "Not available to user.", nil),
+		248: syscalls.PartiallySupported("add_key", AddKey, "Only \"user\" keys and keyrings are supported.", nil),
 		249: syscalls.Error("request_key", linuxerr.EACCES, "Not available to user.", nil),
-		250: syscalls.Error("keyctl", linuxerr.EACCES, "Not available to user.", nil),
+		250: syscalls.PartiallySupported("keyctl", Keyctl, "Only operations on \"user\" keys and keyrings are supported; KEYCTL_CHOWN and later operations are not supported.", nil),
 		251: syscalls.CapError("ioprio_set", linux.CAP_SYS_ADMIN, "", nil), // requires cap_sys_nice or cap_sys_admin (depending)
 		252: syscalls.CapError("ioprio_get", linux.CAP_SYS_ADMIN, "", nil), // requires cap_sys_nice or cap_sys_admin (depending)
 		253: syscalls.PartiallySupportedPoint("inotify_init", InotifyInit, PointInotifyInit, "Inotify events are only available inside the sandbox. Hard links are treated as different watch targets in gofer fs.", nil),
@@ -392,7 +392,7 @@ var AMD64 = &kernel.SyscallTable{
 		334: syscalls.PartiallySupported("rseq", RSeq, "Not supported on all platforms.", nil),
 
 		// Linux skips ahead to syscall 424 to sync numbers between arches.
-		424: syscalls.ErrorWithEvent("pidfd_send_signal", linuxerr.ENOSYS, "", nil),
+		424: syscalls.Supported("pidfd_send_signal", PidfdSendSignal),
 		425: syscalls.ErrorWithEvent("io_uring_setup", linuxerr.ENOSYS, "", nil),
 		426: syscalls.ErrorWithEvent("io_uring_enter", linuxerr.ENOSYS, "", nil),
 		427: syscalls.ErrorWithEvent("io_uring_register", linuxerr.ENOSYS, "", nil),
@@ -402,9 +402,11 @@ var AMD64 = &kernel.SyscallTable{
 		431: syscalls.ErrorWithEvent("fsconfig", linuxerr.ENOSYS, "", nil),
 		432: syscalls.ErrorWithEvent("fsmount", linuxerr.ENOSYS, "", nil),
 		433: syscalls.ErrorWithEvent("fspick", linuxerr.ENOSYS, "", nil),
-		434: syscalls.ErrorWithEvent("pidfd_open", linuxerr.ENOSYS, "", nil),
-		435: syscalls.ErrorWithEvent("clone3", linuxerr.ENOSYS, "", nil),
+		434: syscalls.Supported("pidfd_open", PidfdOpen),
+		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_INTO_CGROUP and set_tid not supported, in addition to those not supported by clone.", nil),
 		436: syscalls.Supported("close_range", CloseRange),
+		438: syscalls.Supported("pidfd_getfd", PidfdGetfd),
+		440: syscalls.Supported("process_madvise", ProcessMadvise),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
 	},
 	Emulate: map[hostarch.Addr]uintptr{
@@ -522,7 +524,7 @@ var ARM64 = &kernel.SyscallTable{
 		89:  syscalls.CapError("acct", linux.CAP_SYS_PACCT, "", nil),
 		90:  syscalls.Supported("capget", Capget),
 		91:  syscalls.Supported("capset", Capset),
-		92:  syscalls.ErrorWithEvent("personality", linuxerr.EINVAL, "Unable to change personality.", nil),
+		92:  syscalls.PartiallySupported("personality", Personality, "Only the PER_LINUX32 execution domain has an effect, and personality flags are ignored.", nil),
 		93:  syscalls.Supported("exit", Exit),
 		94:  syscalls.Supported("exit_group", ExitGroup),
 		95:  syscalls.Supported("waitid", Waitid),
@@ -542,12 +544,12 @@ var ARM64 = &kernel.SyscallTable{
 		109: syscalls.Supported("timer_getoverrun", TimerGetoverrun),
 		110: syscalls.Supported("timer_settime", TimerSettime),
 		111: syscalls.Supported("timer_delete", TimerDelete),
-		112: syscalls.Supported("clock_settime", ClockSettime),
+		112: syscalls.PartiallySupported("clock_settime", ClockSettime, "Only CLOCK_REALTIME can be set, and only in the sandbox.", nil),
 		113: syscalls.Supported("clock_gettime", ClockGettime),
 		114: syscalls.Supported("clock_getres", ClockGetres),
 		115: syscalls.Supported("clock_nanosleep", ClockNanosleep),
 		116: syscalls.PartiallySupported("syslog", Syslog, "Outputs a dummy message for security reasons.", nil),
-		117: syscalls.PartiallySupported("ptrace", Ptrace, "Options PTRACE_PEEKSIGINFO, PTRACE_SECCOMP_GET_FILTER not supported.", nil),
+		117: syscalls.PartiallySupported("ptrace", Ptrace, "Option PTRACE_SECCOMP_GET_FILTER not supported.", nil),
 		118: syscalls.CapError("sched_setparam", linux.CAP_SYS_NICE, "", nil),
 		119: syscalls.PartiallySupported("sched_setscheduler", SchedSetscheduler, "Stub implementation.", nil),
 		120: syscalls.PartiallySupported("sched_getscheduler", SchedGetscheduler, "Stub implementation.", nil),
@@ -600,7 +602,7 @@ var ARM64 = &kernel.SyscallTable{
 		167: syscalls.PartiallySupported("prctl", Prctl, "Not all options are supported.", nil),
 		168: syscalls.Supported("getcpu", Getcpu),
 		169: syscalls.Supported("gettimeofday", Gettimeofday),
-		170: syscalls.CapError("settimeofday", linux.CAP_SYS_TIME, "", nil),
+		170: syscalls.PartiallySupported("settimeofday", Settimeofday, "Only the sandbox's clock is set. The timezone can't be changed.", nil),
 		171: syscalls.CapError("adjtimex", linux.CAP_SYS_TIME, "", nil),
 		172: syscalls.Supported("getpid", Getpid),
 		173: syscalls.Supported("getppid", Getppid),
@@ -647,9 +649,9 @@ var ARM64 = &kernel.SyscallTable{
 		214: syscalls.Supported("brk", Brk),
 		215: syscalls.Supported("munmap", Munmap),
 		216: syscalls.Supported("mremap", Mremap),
-		217: syscalls.Error("add_key", linuxerr.EACCES, "Not available to user.", nil),
+		217: syscalls.PartiallySupported("add_key", AddKey, "Only \"user\" keys and keyrings are supported.", nil),
 		218: syscalls.Error("request_key", linuxerr.EACCES, "Not available to user.", nil),
-		219: syscalls.Error("keyctl", linuxerr.EACCES, "Not available to user.", nil),
+		219: syscalls.PartiallySupported("keyctl", Keyctl, "Only operations on \"user\" keys and keyrings are supported; KEYCTL_CHOWN and later operations are not supported.", nil),
 		220: syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Mount namespace (CLONE_NEWNS) not supported. Options CLONE_PARENT, CLONE_SYSVSEM not supported.", nil),
 		221: syscalls.SupportedPoint("execve", Execve, PointExecve),
 		222: syscalls.PartiallySupported("mmap", Mmap, "Generally supported with exceptions. Options MAP_FIXED_NOREPLACE, MAP_SHARED_VALIDATE, MAP_SYNC MAP_GROWSDOWN, MAP_HUGETLB are not supported.", nil),
@@ -662,8 +664,8 @@ var ARM64 = &kernel.SyscallTable{
 		229: syscalls.PartiallySupported("munlock", Munlock, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
 		230: syscalls.PartiallySupported("mlockall", Mlockall, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
 		231: syscalls.PartiallySupported("munlockall", Munlockall, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
-		232: syscalls.PartiallySupported("mincore", Mincore, "Stub implementation. The sandbox does not have access to this information. Reports all mapped pages are resident.", nil),
-		233: syscalls.PartiallySupported("madvise", Madvise, "Options MADV_DONTNEED, MADV_DONTFORK are supported. Other advice is ignored.", nil),
+		232: syscalls.PartiallySupported("mincore", Mincore, "Pages of files cached in sentry memory are reported as for cachestat(2); all other mapped pages are reported resident.", nil),
+		233: syscalls.PartiallySupported("madvise", Madvise, "Options MADV_DONTNEED, MADV_DONTFORK, MADV_COLD and MADV_PAGEOUT are supported. Other advice is ignored.", nil),
 		234: syscalls.ErrorWithEvent("remap_file_pages", linuxerr.ENOSYS, "Deprecated since Linux 3.16.", nil),
 		235: syscalls.PartiallySupported("mbind", Mbind, "Stub implementation. Only a single NUMA node is advertised, and mempolicy is ignored accordingly, but mbind() will succeed and has effects reflected by get_mempolicy.", []string{"gvisor.dev/issue/262"}),
 		236: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "Stub implementation.", nil),
@@ -712,7 +714,7 @@ var ARM64 = &kernel.SyscallTable{
 		293: syscalls.PartiallySupported("rseq", RSeq, "Not supported on all platforms.", nil),
 
 		// Linux skips ahead to syscall 424 to sync numbers between arches.
-		424: syscalls.ErrorWithEvent("pidfd_send_signal", linuxerr.ENOSYS, "", nil),
+		424: syscalls.Supported("pidfd_send_signal", PidfdSendSignal),
 		425: syscalls.ErrorWithEvent("io_uring_setup", linuxerr.ENOSYS, "", nil),
 		426: syscalls.ErrorWithEvent("io_uring_enter", linuxerr.ENOSYS, "", nil),
 		427: syscalls.ErrorWithEvent("io_uring_register", linuxerr.ENOSYS, "", nil),
@@ -722,9 +724,11 @@ var ARM64 = &kernel.SyscallTable{
 		431: syscalls.ErrorWithEvent("fsconfig", linuxerr.ENOSYS, "", nil),
 		432: syscalls.ErrorWithEvent("fsmount", linuxerr.ENOSYS, "", nil),
 		433: syscalls.ErrorWithEvent("fspick", linuxerr.ENOSYS, "", nil),
-		434: syscalls.ErrorWithEvent("pidfd_open", linuxerr.ENOSYS, "", nil),
-		435: syscalls.ErrorWithEvent("clone3", linuxerr.ENOSYS, "", nil),
+		434: syscalls.Supported("pidfd_open", PidfdOpen),
+		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_INTO_CGROUP and set_tid not supported, in addition to those not supported by clone.", nil),
 		436: syscalls.Supported("close_range", CloseRange),
+		438: syscalls.Supported("pidfd_getfd", PidfdGetfd),
+		440: syscalls.Supported("process_madvise", ProcessMadvise),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
 	},
 	Emulate: map[hostarch.Addr]uintptr{},
@@ -1000,6 +1000,11 @@ func Fcntl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	switch cmd {
 	case linux.F_DUPFD, linux.F_DUPFD_CLOEXEC:
 		from := args[2].Int()
+		// Unlike the other dup variants, F_DUPFD reports a minimum beyond
+		// RLIMIT_NOFILE as EINVAL. See Linux's fs/fcntl.c:f_dupfd().
+		if lim := limits.FromContext(t).Get(limits.NumberOfFiles); lim.Cur != limits.Infinity && uint64(from) >= lim.Cur {
+			return 0, nil, linuxerr.EINVAL
+		}
 		fd, err := t.NewFDFrom(from, file, kernel.FDFlags{
 			CloseOnExec: cmd == linux.F_DUPFD_CLOEXEC,
 		})
@@ -0,0 +1,307 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+const (
+	// keyTypeMaxLen is the maximum length of a key type name, including the
+	// NUL terminator. See Linux's security/keys/keyctl.c:key_get_type_from_user().
+	keyTypeMaxLen = 32
+
+	// keyPayloadMaxLen is the maximum length of a key payload accepted by
+	// add_key(2) and keyctl(KEYCTL_UPDATE).
+	keyPayloadMaxLen = 1024 * 1024
+)
+
+// copyInKeyType copies in and parses the name of a key type.
+func copyInKeyType(t *kernel.Task, addr hostarch.Addr) (auth.KeyType, error) {
+	name, err := t.CopyInString(addr, keyTypeMaxLen)
+	if err != nil {
+		return 0, err
+	}
+	// "Key types that begin with a period are reserved to the
+	// implementation." - keyctl(2)
+	if len(name) > 0 && name[0] == '.' {
+		return 0, linuxerr.EPERM
+	}
+	keyType, ok := auth.ParseKeyType(name)
+	if !ok {
+		return 0, linuxerr.ENODEV
+	}
+	return keyType, nil
+}
+
+// copyInKeyDescription copies in a key description, which must not be empty.
+func copyInKeyDescription(t *kernel.Task, addr hostarch.Addr) (string, error) {
+	desc, err := t.CopyInString(addr, linux.KEY_MAX_DESC_SIZE)
+	if err != nil {
+		return "", err
+	}
+	if desc == "" {
+		return "", linuxerr.EINVAL
+	}
+	return desc, nil
+}
+
+// copyInKeyPayload copies in the payload of a key of the given type.
+func copyInKeyPayload(t *kernel.Task, keyType auth.KeyType, addr hostarch.Addr, plen uint) ([]byte, error) {
+	if plen > keyPayloadMaxLen {
+		return nil, linuxerr.E2BIG
+	}
+	switch keyType {
+	case auth.KeyTypeUser:
+		if plen > linux.KEY_USER_MAX_PAYLOAD {
+			return nil, linuxerr.EINVAL
+		}
+	case auth.KeyTypeKeyring:
+		// Keyrings can't be instantiated with a payload.
+		if plen != 0 {
+			return nil, linuxerr.EINVAL
+		}
+	}
+	if plen == 0 {
+		return nil, nil
+	}
+	if addr == 0 {
+		return nil, linuxerr.EFAULT
+	}
+	payload := make([]byte, plen)
+	if _, err := t.CopyInBytes(addr, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// retryKeyQuota calls fn, and calls it again after collecting unreachable
+// keys if it fails because the user's key quota is exhausted. Keys are
+// otherwise only collected when /proc/keys is read.
+func retryKeyQuota(t *kernel.Task, fn func() error) error {
+	err := fn()
+	if linuxerr.Equals(linuxerr.EDQUOT, err) {
+		t.Kernel().CollectKeys()
+		err = fn()
+	}
+	return err
+}
+
+// AddKey implements Linux syscall add_key(2).
+func AddKey(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	typeAddr := args[0].Pointer()
+	descAddr := args[1].Pointer()
+	payloadAddr := args[2].Pointer()
+	plen := args[3].SizeT()
+	keyringSerial := auth.KeySerial(args[4].Int())
+
+	keyType, err := copyInKeyType(t, typeAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	desc, err := copyInKeyDescription(t, descAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	payload, err := copyInKeyPayload(t, keyType, payloadAddr, plen)
+	if err != nil {
+		return 0, nil, err
+	}
+	keyring, err := t.LookupKey(keyringSerial, true /* create */)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var key *auth.Key
+	if err := retryKeyQuota(t, func() error {
+		var err error
+		key, err = t.Keys().Add(t.KeyRequester(), keyType, desc, payload, keyring)
+		return err
+	}); err != nil {
+		return 0, nil, err
+	}
+	return uintptr(key.Serial()), nil, nil
+}
+
+// Keyctl implements Linux syscall keyctl(2).
+func Keyctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	op := args[0].Int()
+	keys := t.Keys()
+
+	switch op {
+	case linux.KEYCTL_GET_KEYRING_ID:
+		key, err := t.LookupKey(auth.KeySerial(args[1].Int()), args[2].Int() != 0)
+		if err != nil {
+			return 0, nil, err
+		}
+		return uintptr(key.Serial()), nil, nil
+
+	case linux.KEYCTL_JOIN_SESSION_KEYRING:
+		var name string
+		if nameAddr := args[1].Pointer(); nameAddr != 0 {
+			var err error
+			if name, err = copyInKeyDescription(t, nameAddr); err != nil {
+				return 0, nil, err
+			}
+		}
+		var key *auth.Key
+		if err := retryKeyQuota(t, func() error {
+			var err error
+			key, err = t.JoinSessionKeyring(name)
+			return err
+		}); err != nil {
+			return 0, nil, err
+		}
+		return uintptr(key.Serial()), nil, nil
+
+	case linux.KEYCTL_UPDATE:
+		key, err := t.LookupKey(auth.KeySerial(args[1].Int()), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload, err := copyInKeyPayload(t, key.Type(), args[2].Pointer(), args[3].SizeT())
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, retryKeyQuota(t, func() error {
+			return keys.Update(t.KeyRequester(), key, payload)
+		})
+
+	case linux.KEYCTL_REVOKE:
+		key, err := t.LookupKey(auth.KeySerial(args[1].Int()), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.Revoke(t.KeyRequester(), key)
+
+	case linux.KEYCTL_SETPERM:
+		key, err := t.LookupKey(auth.KeySerial(args[1].Int()), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.SetPerm(t.KeyRequester(), key, auth.KeyPermissions(args[2].Uint()))
+
+	case linux.KEYCTL_DESCRIBE:
+		key, err := t.LookupKey(auth.KeySerial(args[1].Int()), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		desc, err := keys.Describe(t.KeyRequester(), key)
+		if err != nil {
+			return 0, nil, err
+		}
+		// The returned length includes the NUL terminator, and the
+		// description is only copied out if it fits entirely.
+		buf := append([]byte(desc), 0)
+		if addr, buflen := args[2].Pointer(), args[3].SizeT(); addr != 0 && buflen >= uint(len(buf)) {
+			if _, err := t.CopyOutBytes(addr, buf); err != nil {
+				return 0, nil, err
+			}
+		}
+		return uintptr(len(buf)), nil, nil
+
+	case linux.KEYCTL_CLEAR:
+		keyring, err := t.LookupKey(auth.KeySerial(args[1].Int()), true /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.Clear(t.KeyRequester(), keyring)
+
+	case linux.KEYCTL_LINK:
+		key, err := t.LookupKey(auth.KeySerial(args[1].Int()), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		keyring, err := t.LookupKey(auth.KeySerial(args[2].Int()), true /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.Link(t.KeyRequester(), key, keyring)
+
+	case linux.KEYCTL_UNLINK:
+		key, err := t.LookupKey(auth.KeySerial(args[1].Int()), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		keyring, err := t.LookupKey(auth.KeySerial(args[2].Int()), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.Unlink(t.KeyRequester(), key, keyring)
+
+	case linux.KEYCTL_SEARCH:
+		keyring, err := t.LookupKey(auth.KeySerial(args[1].Int()), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		keyType, err := copyInKeyType(t, args[2].Pointer())
+		if err != nil {
+			return 0, nil, err
+		}
+		desc, err := copyInKeyDescription(t, args[3].Pointer())
+		if err != nil {
+			return 0, nil, err
+		}
+		// "If destination is not zero, then ... the key ... will be linked
+		// into the keyring whose ID is specified in destination." - keyctl(2)
+		var dest *auth.Key
+		if destSerial := auth.KeySerial(args[4].Int()); destSerial != 0 {
+			if dest, err = t.LookupKey(destSerial, true /* create */); err != nil {
+				return 0, nil, err
+			}
+		}
+		r := t.KeyRequester()
+		key, err := keys.Search(r, keyring, keyType, desc)
+		if err != nil {
+			return 0, nil, err
+		}
+		if dest != nil {
+			if err := keys.Link(r, key, dest); err != nil {
+				return 0, nil, err
+			}
+		}
+		return uintptr(key.Serial()), nil, nil
+
+	case linux.KEYCTL_READ:
+		key, err := t.LookupKey(auth.KeySerial(args[1].Int()), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		buf, err := keys.Read(t.KeyRequester(), key)
+		if err != nil {
+			return 0, nil, err
+		}
+		// At most buflen bytes are copied out, but the full length of the
+		// payload is returned.
+		n := len(buf)
+		if addr, buflen := args[2].Pointer(), args[3].SizeT(); addr != 0 && buflen != 0 {
+			if buflen < uint(len(buf)) {
+				buf = buf[:buflen]
+			}
+			if _, err := t.CopyOutBytes(addr, buf); err != nil {
+				return 0, nil, err
+			}
+		}
+		return uintptr(n), nil, nil
+
+	default:
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+}
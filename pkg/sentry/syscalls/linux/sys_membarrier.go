@@ -85,7 +85,7 @@ func Membarrier(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sy
 		}
 		// MEMBARRIER_CMD_FLAG_CPU and cpu_id are ignored since we don't have
 		// the ability to preempt specific CPUs.
-		return 0, nil, t.Kernel().Platform.PreemptAllCPUs()
+		return 0, nil, t.PreemptRSeq()
 	case linux.MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED_RSEQ:
 		if flags != 0 {
 			return 0, nil, linuxerr.EINVAL
@@ -16,6 +16,7 @@ package linux
 
 import (
 	"fmt"
+	"math/bits"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -25,12 +26,14 @@ import (
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
-// We unconditionally report a single NUMA node. This also means that our
-// "nodemask_t" is a single unsigned long (uint64).
-const (
-	maxNodes        = 1
-	allowedNodemask = (1 << maxNodes) - 1
-)
+// numaNodes returns the number of NUMA nodes reported to t, and the mask of
+// all of them. We report a single node unless the sentry is configured with a
+// synthetic NUMA topology, which has at most 64 nodes, so our "nodemask_t" is
+// a single unsigned long (uint64).
+func numaNodes(t *kernel.Task) (uint32, uint64) {
+	n := t.Kernel().NUMANodes()
+	return uint32(n), uint64(1)<<n - 1
+}
 
 func copyInNodemask(t *kernel.Task, addr hostarch.Addr, maxnode uint32) (uint64, error) {
 	// "nodemask points to a bit mask of node IDs that contains up to maxnode
@@ -57,7 +60,7 @@ func copyInNodemask(t *kernel.Task, addr hostarch.Addr, maxnode uint32) (uint64,
 	val := hostarch.ByteOrder.Uint64(buf)
 	// Check that only allowed bits in the first unsigned long in the nodemask
 	// are set.
-	if val&^allowedNodemask != 0 {
+	if _, allowedNodemask := numaNodes(t); val&^allowedNodemask != 0 {
 		return 0, linuxerr.EINVAL
 	}
 	// Check that all remaining bits in the nodemask are 0.
@@ -115,6 +118,7 @@ func GetMempolicy(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 	nodeFlag := flags&linux.MPOL_F_NODE != 0
 	addrFlag := flags&linux.MPOL_F_ADDR != 0
 	memsAllowed := flags&linux.MPOL_F_MEMS_ALLOWED != 0
+	maxNodes, allowedNodemask := numaNodes(t)
 
 	// "EINVAL: The value specified by maxnode is less than the number of node
 	// IDs supported by the system." - get_mempolicy(2)
@@ -163,7 +167,7 @@ func GetMempolicy(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 			if err != nil {
 				return 0, nil, err
 			}
-			policy = linux.MPOL_DEFAULT // maxNodes == 1
+			policy = linux.NumaPolicy(t.MemoryManager().NumaNode(addr))
 		}
 		if mode != 0 {
 			if _, err := policy.CopyOut(t, mode); err != nil {
@@ -200,7 +204,9 @@ func GetMempolicy(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 		if policy&^linux.MPOL_MODE_FLAGS != linux.MPOL_INTERLEAVE {
 			return 0, nil, linuxerr.EINVAL
 		}
-		policy = linux.MPOL_DEFAULT // maxNodes == 1
+		// We don't interleave internal allocations, so report the first
+		// node in the interleave set.
+		policy = linux.NumaPolicy(bits.TrailingZeros64(nodemaskVal))
 	}
 	if mode != 0 {
 		if _, err := policy.CopyOut(t, mode); err != nil {
@@ -253,8 +259,9 @@ func Mbind(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 		return 0, nil, err
 	}
 
-	// Since we claim to have only a single node, all flags can be ignored
-	// (since all pages must already be on that single node).
+	// The policy only applies to pages allocated after this point. Existing
+	// pages aren't migrated, so MPOL_MF_MOVE and MPOL_MF_MOVE_ALL are
+	// ignored; with a single node, all pages are already on that node.
 	err = t.MemoryManager().SetNumaPolicy(addr, length, mode, nodemaskVal)
 	return 0, nil, err
 }
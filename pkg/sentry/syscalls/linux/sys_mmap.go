@@ -15,8 +15,6 @@
 package linux
 
 import (
-	"bytes"
-
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
@@ -196,6 +194,10 @@ func Madvise(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 		return 0, nil, t.MemoryManager().SetDontFork(addr, length, false)
 	case linux.MADV_DONTFORK:
 		return 0, nil, t.MemoryManager().SetDontFork(addr, length, true)
+	case linux.MADV_COLD:
+		return 0, nil, t.MemoryManager().Pageout(addr, length, true /* cold */)
+	case linux.MADV_PAGEOUT:
+		return 0, nil, t.MemoryManager().Pageout(addr, length, false /* cold */)
 	case linux.MADV_HUGEPAGE, linux.MADV_NOHUGEPAGE:
 		fallthrough
 	case linux.MADV_MERGEABLE, linux.MADV_UNMERGEABLE:
@@ -220,6 +222,99 @@ func Madvise(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 	}
 }
 
+// ProcessMadvise implements linux syscall process_madvise(2).
+func ProcessMadvise(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	pidfd := args[0].Int()
+	iovAddr := args[1].Pointer()
+	iovCnt := int(args[2].Int())
+	adv := args[3].Int()
+	flags := args[4].Uint()
+
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Only advice that doesn't have application-visible side effects may be
+	// applied to other processes.
+	switch adv {
+	case linux.MADV_COLD, linux.MADV_PAGEOUT, linux.MADV_WILLNEED:
+	default:
+		return 0, nil, linuxerr.EINVAL
+	}
+	if iovCnt < 0 || iovCnt > linux.UIO_MAXIOV {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	tg, _, err := getPIDFD(t, pidfd)
+	if err != nil {
+		return 0, nil, err
+	}
+	target := tg.Leader()
+	if target == nil {
+		return 0, nil, linuxerr.ESRCH
+	}
+	// "Permission to apply advice to another process is governed by ptrace
+	// access mode PTRACE_MODE_READ_REALCREDS check; in addition, because of
+	// the performance implications of applying the advice, the caller must
+	// have the CAP_SYS_NICE capability." - process_madvise(2)
+	if !t.CanTrace(target, false /* attach */) || !t.HasCapability(linux.CAP_SYS_NICE) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	var tmm *mm.MemoryManager
+	target.WithMuLocked(func(target *kernel.Task) {
+		if m := target.MemoryManager(); m != nil && m.IncUsers() {
+			tmm = m
+		}
+	})
+	if tmm == nil {
+		return 0, nil, linuxerr.ESRCH
+	}
+	defer tmm.DecUsers(t)
+
+	ars, err := t.CopyInIovecs(iovAddr, iovCnt)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// As for readv(2) and writev(2), the number of bytes advised is returned
+	// if any advice was applied before an error occurred.
+	var total uint64
+	for ; !ars.IsEmpty(); ars = ars.Tail() {
+		ar := ars.Head()
+		if err := processMadviseRange(tmm, ar, adv); err != nil {
+			if total != 0 {
+				break
+			}
+			return 0, nil, err
+		}
+		total += ar.Length()
+	}
+	return uintptr(total), nil, nil
+}
+
+// processMadviseRange applies the given advice to ar in tmm.
+func processMadviseRange(tmm *mm.MemoryManager, ar hostarch.AddrRange, adv int32) error {
+	if ar.Start.RoundDown() != ar.Start {
+		return linuxerr.EINVAL
+	}
+	if ar.Length() == 0 {
+		return nil
+	}
+	lenAddr, ok := hostarch.Addr(ar.Length()).RoundUp()
+	if !ok {
+		return linuxerr.EINVAL
+	}
+	switch adv {
+	case linux.MADV_COLD:
+		return tmm.Pageout(ar.Start, uint64(lenAddr), true /* cold */)
+	case linux.MADV_PAGEOUT:
+		return tmm.Pageout(ar.Start, uint64(lenAddr), false /* cold */)
+	default:
+		// MADV_WILLNEED is ignored, as for madvise(2).
+		return nil
+	}
+}
+
 // Mincore implements the syscall mincore(2).
 func Mincore(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
@@ -241,14 +336,15 @@ func Mincore(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 		return 0, nil, linuxerr.ENOMEM
 	}
 
-	// Pretend that all mapped pages are "resident in core".
-	mapped := t.MemoryManager().VirtualMemorySizeRange(ar)
+	if la == 0 {
+		return 0, nil, nil
+	}
 	// "ENOMEM: addr to addr + length contained unmapped memory."
-	if mapped != uint64(la) {
-		return 0, nil, linuxerr.ENOMEM
+	resident, err := t.MemoryManager().Mincore(ar)
+	if err != nil {
+		return 0, nil, err
 	}
-	resident := bytes.Repeat([]byte{1}, int(mapped/hostarch.PageSize))
-	_, err := t.CopyOutBytes(vec, resident)
+	_, err = t.CopyOutBytes(vec, resident)
 	return 0, nil, err
 }
 
@@ -139,12 +139,16 @@ func Msgctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	switch cmd {
 	case linux.IPC_INFO:
 		info := r.IPCInfo(t)
-		_, err := info.CopyOut(t, buf)
-		return 0, nil, err
+		if _, err := info.CopyOut(t, buf); err != nil {
+			return 0, nil, err
+		}
+		return uintptr(r.HighestIndex()), nil, nil
 	case linux.MSG_INFO:
 		msgInfo := r.MsgInfo(t)
-		_, err := msgInfo.CopyOut(t, buf)
-		return 0, nil, err
+		if _, err := msgInfo.CopyOut(t, buf); err != nil {
+			return 0, nil, err
+		}
+		return uintptr(r.HighestIndex()), nil, nil
 	case linux.IPC_RMID:
 		return 0, nil, r.Remove(id, creds)
 	}
@@ -156,23 +160,29 @@ func Msgctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	}
 
 	switch cmd {
-	case linux.MSG_STAT:
+	case linux.MSG_STAT, linux.MSG_STAT_ANY:
 		// Technically, we should be treating id as "an index into the kernel's
 		// internal array that maintains information about all shared memory
 		// segments on the system". Since we don't track segments in an array,
 		// we'll just pretend the msqid is the index and do the same thing as
 		// IPC_STAT. Linux also uses the index as the msqid.
-		fallthrough
-	case linux.IPC_STAT:
-		stat, err := queue.Stat(t)
+		var stat *linux.MsqidDS
+		if cmd == linux.MSG_STAT {
+			stat, err = queue.Stat(t)
+		} else {
+			stat, err = queue.StatAny(t)
+		}
 		if err != nil {
 			return 0, nil, err
 		}
-		_, err = stat.CopyOut(t, buf)
-		return 0, nil, err
+		if _, err := stat.CopyOut(t, buf); err != nil {
+			return 0, nil, err
+		}
+		// MSG_STAT and MSG_STAT_ANY return the msqid of the queue.
+		return uintptr(queue.ID()), nil, nil
 
-	case linux.MSG_STAT_ANY:
-		stat, err := queue.StatAny(t)
+	case linux.IPC_STAT:
+		stat, err := queue.Stat(t)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -0,0 +1,37 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// Personality implements Linux syscall personality(2).
+//
+// Execution domains other than PER_LINUX and PER_LINUX32 and personality
+// flags are recorded and returned, but have no effect.
+func Personality(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	persona := args[0].Uint()
+	old := t.Personality()
+	if persona != linux.PersonalityQuery {
+		if persona&linux.PER_MASK != linux.PER_LINUX && persona&linux.PER_MASK != linux.PER_LINUX32 {
+			t.Debugf("Unsupported execution domain in personality %#x", persona)
+		}
+		t.SetPersonality(persona)
+	}
+	return uintptr(old), nil, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// getPIDFD returns the thread group referred to by the pidfd fd, and the
+// status flags of fd.
+func getPIDFD(t *kernel.Task, fd int32) (*kernel.ThreadGroup, uint32, error) {
+	file := t.GetFileVFS2(fd)
+	if file == nil {
+		return nil, 0, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	pidfd, ok := file.Impl().(*kernel.PIDFD)
+	if !ok {
+		return nil, 0, linuxerr.EBADF
+	}
+	return pidfd.ThreadGroup(), file.StatusFlags(), nil
+}
+
+// PidfdOpen implements linux syscall pidfd_open(2).
+func PidfdOpen(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	pid := kernel.ThreadID(args[0].Int())
+	flags := args[1].Uint()
+
+	if flags&^linux.PIDFD_NONBLOCK != 0 || pid <= 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	tg := t.PIDNamespace().ThreadGroupWithID(pid)
+	if tg == nil {
+		// pidfds can only refer to thread group leaders.
+		if t.PIDNamespace().TaskWithID(pid) != nil {
+			return 0, nil, linuxerr.EINVAL
+		}
+		return 0, nil, linuxerr.ESRCH
+	}
+
+	file, err := kernel.NewPIDFD(t, t.Kernel().VFS(), tg, flags)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+	// pidfds are always close-on-exec, as in Linux.
+	fd, err := t.NewFDFromVFS2(0, file, kernel.FDFlags{
+		CloseOnExec: true,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return uintptr(fd), nil, nil
+}
+
+// PidfdSendSignal implements linux syscall pidfd_send_signal(2).
+func PidfdSendSignal(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	pidfd := args[0].Int()
+	sig := linux.Signal(args[1].Int())
+	infoAddr := args[2].Pointer()
+	flags := args[3].Uint()
+
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	tg, _, err := getPIDFD(t, pidfd)
+	if err != nil {
+		return 0, nil, err
+	}
+	// The process must be in the caller's PID namespace or one of its
+	// descendants.
+	if !t.PIDNamespace().IsAncestorOf(tg.PIDNamespace()) {
+		return 0, nil, linuxerr.EINVAL
+	}
+	target := tg.Leader()
+
+	var info *linux.SignalInfo
+	if infoAddr != 0 {
+		// As in RtSigqueueinfo, the sender can only use si_codes used by
+		// the kernel or SI_TKILL to signal itself.
+		info = &linux.SignalInfo{}
+		if _, err := info.CopyIn(t, infoAddr); err != nil {
+			return 0, nil, err
+		}
+		if info.Signo != int32(sig) {
+			return 0, nil, linuxerr.EINVAL
+		}
+		if (info.Code >= 0 || info.Code == linux.SI_TKILL) && target != t {
+			return 0, nil, linuxerr.EPERM
+		}
+	} else {
+		info = &linux.SignalInfo{
+			Signo: int32(sig),
+			Code:  linux.SI_USER,
+		}
+		info.SetPID(int32(tg.PIDNamespace().IDOfTask(t)))
+		info.SetUID(int32(t.Credentials().RealKUID.In(target.UserNamespace()).OrOverflow()))
+	}
+
+	if !mayKill(t, target, sig) {
+		return 0, nil, linuxerr.EPERM
+	}
+	// Unlike kill(2), this doesn't race with execve, since tg.SendSignal uses
+	// the current leader of tg.
+	return 0, nil, tg.SendSignal(info)
+}
+
+// PidfdGetfd implements linux syscall pidfd_getfd(2).
+func PidfdGetfd(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	pidfd := args[0].Int()
+	targetFD := args[1].Int()
+	flags := args[2].Uint()
+
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	tg, _, err := getPIDFD(t, pidfd)
+	if err != nil {
+		return 0, nil, err
+	}
+	target := tg.Leader()
+	if target.ExitState() == kernel.TaskExitDead {
+		return 0, nil, linuxerr.ESRCH
+	}
+	// "Permission to duplicate another process's file descriptor is governed
+	// by a ptrace access mode PTRACE_MODE_ATTACH_REALCREDS check" -
+	// pidfd_getfd(2)
+	if !t.CanTrace(target, true /* attach */) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	var file *vfs.FileDescription
+	target.WithMuLocked(func(target *kernel.Task) {
+		if fdTable := target.FDTable(); fdTable != nil {
+			file, _ = fdTable.GetVFS2(targetFD)
+		}
+	})
+	if file == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	// The new file descriptor is always close-on-exec, as in Linux.
+	fd, err := t.NewFDFromVFS2(0, file, kernel.FDFlags{
+		CloseOnExec: true,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return uintptr(fd), nil, nil
+}
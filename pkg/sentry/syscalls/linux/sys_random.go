@@ -20,7 +20,6 @@ import (
 
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
-	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/safemem"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
@@ -30,22 +29,30 @@ import (
 const (
 	_GRND_NONBLOCK = 0x1
 	_GRND_RANDOM   = 0x2
+	_GRND_INSECURE = 0x4
 )
 
 // GetRandom implements the linux syscall getrandom(2).
 //
+// Random bytes are produced by the task's random number generator, which is
+// seeded from the host, so that most calls don't need to make any host
+// syscalls.
+//
 // In a multi-tenant/shared environment, the only valid implementation is to
 // fetch data from the urandom pool, otherwise starvation attacks become
-// possible. The urandom pool is also expected to have plenty of entropy, thus
-// the GRND_RANDOM flag is ignored. The GRND_NONBLOCK flag does not apply, as
-// the pool will already be initialized.
+// possible. As in Linux 5.6 and later, the GRND_RANDOM flag thus doesn't
+// select a separate, blocking pool. The GRND_NONBLOCK and GRND_INSECURE flags
+// do not apply, as the pool will already be initialized.
 func GetRandom(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
 	length := args[1].SizeT()
 	flags := args[2].Int()
 
 	// Flags are checked for validity but otherwise ignored. See above.
-	if flags & ^(_GRND_NONBLOCK|_GRND_RANDOM) != 0 {
+	if flags & ^(_GRND_NONBLOCK|_GRND_RANDOM|_GRND_INSECURE) != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if flags&(_GRND_INSECURE|_GRND_RANDOM) == _GRND_INSECURE|_GRND_RANDOM {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -65,7 +72,7 @@ func GetRandom(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	if min > 256 {
 		min = 256
 	}
-	n, err := t.MemoryManager().CopyOutFrom(t, hostarch.AddrRangeSeqOf(ar), safemem.FromIOReader{&randReader{-1, min}}, usermem.IOOpts{
+	n, err := t.MemoryManager().CopyOutFrom(t, hostarch.AddrRangeSeqOf(ar), safemem.FromIOReader{&randReader{t.Random(), -1, min}}, usermem.IOOpts{
 		AddressSpaceActive: true,
 	})
 	if n >= int64(min) {
@@ -74,8 +81,9 @@ func GetRandom(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	return 0, nil, err
 }
 
-// randReader is a io.Reader that handles partial reads from rand.Reader.
+// randReader is a io.Reader that handles partial reads from r.
 type randReader struct {
+	r    io.Reader
 	done int
 	min  int
 }
@@ -83,11 +91,11 @@ type randReader struct {
 // Read implements io.Reader.Read.
 func (r *randReader) Read(dst []byte) (int, error) {
 	if r.done >= r.min {
-		return rand.Reader.Read(dst)
+		return r.r.Read(dst)
 	}
 	min := r.min - r.done
 	if min > len(dst) {
 		min = len(dst)
 	}
-	return io.ReadAtLeast(rand.Reader, dst, min)
+	return io.ReadAtLeast(r.r, dst, min)
 }
@@ -89,19 +89,21 @@ var setableLimits = map[limits.LimitType]struct{}{
 	limits.Data:          {},
 	limits.FileSize:      {},
 	limits.MemoryLocked:  {},
+	limits.ProcessCount:  {},
 	limits.Stack:         {},
 	// RSS can be set, but it's not enforced because Linux doesn't enforce it
 	// either: "This limit has effect only in Linux 2.4.x, x < 30"
 	limits.Rss: {},
-	// These are not enforced, but we include them here to avoid returning
-	// EPERM, since some apps expect them to succeed.
-	limits.Core:         {},
-	limits.ProcessCount: {},
+	// This is not enforced, but we include it here to avoid returning EPERM,
+	// since some apps expect it to succeed.
+	limits.Core: {},
 }
 
-func prlimit64(t *kernel.Task, resource limits.LimitType, newLim *limits.Limit) (limits.Limit, error) {
+// prlimit64 gets the limit of resource for target and, if newLim is not nil,
+// sets it on behalf of t.
+func prlimit64(t, target *kernel.Task, resource limits.LimitType, newLim *limits.Limit) (limits.Limit, error) {
 	if newLim == nil {
-		return t.ThreadGroup().Limits().Get(resource), nil
+		return target.ThreadGroup().Limits().Get(resource), nil
 	}
 
 	if _, ok := setableLimits[resource]; !ok {
@@ -113,13 +115,19 @@ func prlimit64(t *kernel.Task, resource limits.LimitType, newLim *limits.Limit)
 	// to either limit value."
 	privileged := t.HasCapabilityIn(linux.CAP_SYS_RESOURCE, t.Kernel().RootUserNamespace())
 
-	oldLim, err := t.ThreadGroup().Limits().Set(resource, *newLim, privileged)
+	// Even privileged processes can't raise RLIMIT_NOFILE beyond
+	// /proc/sys/fs/nr_open, which is kernel.MaxFdLimit in the sentry.
+	if resource == limits.NumberOfFiles && newLim.Max > uint64(kernel.MaxFdLimit) {
+		return limits.Limit{}, linuxerr.EPERM
+	}
+
+	oldLim, err := target.ThreadGroup().Limits().Set(resource, *newLim, privileged)
 	if err != nil {
 		return limits.Limit{}, err
 	}
 
 	if resource == limits.CPU {
-		t.NotifyRlimitCPUUpdated()
+		target.NotifyRlimitCPUUpdated()
 	}
 	return oldLim, nil
 }
@@ -136,7 +144,7 @@ func Getrlimit(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	if err != nil {
 		return 0, nil, err
 	}
-	lim, err := prlimit64(t, resource, nil)
+	lim, err := prlimit64(t, t, resource, nil)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -160,7 +168,7 @@ func Setrlimit(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	if _, err := rlim.CopyIn(t, addr); err != nil {
 		return 0, nil, linuxerr.EFAULT
 	}
-	_, err = prlimit64(t, resource, rlim.toLimit())
+	_, err = prlimit64(t, t, resource, rlim.toLimit())
 	return 0, nil, err
 }
 
@@ -199,7 +207,7 @@ func Prlimit64(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	// saved set user IDs of the target process must match the real user ID of
 	// the caller and the real, effective, and saved set group IDs of the
 	// target process must match the real group ID of the caller."
-	if ot != t && !t.HasCapabilityIn(linux.CAP_SYS_RESOURCE, t.PIDNamespace().UserNamespace()) {
+	if ot != t && !t.HasCapabilityIn(linux.CAP_SYS_RESOURCE, ot.UserNamespace()) {
 		cred, tcred := t.Credentials(), ot.Credentials()
 		if cred.RealKUID != tcred.RealKUID ||
 			cred.RealKUID != tcred.EffectiveKUID ||
@@ -211,7 +219,7 @@ func Prlimit64(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 		}
 	}
 
-	oldLim, err := prlimit64(ot, resource, newLim)
+	oldLim, err := prlimit64(t, ot, resource, newLim)
 	if err != nil {
 		return 0, nil, err
 	}
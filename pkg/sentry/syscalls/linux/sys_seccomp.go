@@ -40,39 +40,82 @@ type userSockFprog struct {
 }
 
 // seccomp applies a seccomp policy to the current task.
-func seccomp(t *kernel.Task, mode, flags uint64, addr hostarch.Addr) error {
-	// We only support SECCOMP_SET_MODE_FILTER at the moment.
-	if mode != linux.SECCOMP_SET_MODE_FILTER {
+func seccomp(t *kernel.Task, mode, flags uint64, addr hostarch.Addr) (uintptr, error) {
+	switch mode {
+	case linux.SECCOMP_SET_MODE_FILTER:
+	case linux.SECCOMP_GET_NOTIF_SIZES:
+		if flags != 0 {
+			return 0, linuxerr.EINVAL
+		}
+		sizes := linux.SeccompNotifSizes{
+			Notif:     uint16((*linux.SeccompNotif)(nil).SizeBytes()),
+			NotifResp: uint16((*linux.SeccompNotifResp)(nil).SizeBytes()),
+			Data:      uint16((*linux.SeccompData)(nil).SizeBytes()),
+		}
+		_, err := sizes.CopyOut(t, addr)
+		return 0, err
+	default:
 		// Unsupported mode.
-		return linuxerr.EINVAL
+		return 0, linuxerr.EINVAL
 	}
 
 	tsync := flags&linux.SECCOMP_FILTER_FLAG_TSYNC != 0
+	newListener := flags&linux.SECCOMP_FILTER_FLAG_NEW_LISTENER != 0
 
-	// The only flag we support now is SECCOMP_FILTER_FLAG_TSYNC.
-	if flags&^linux.SECCOMP_FILTER_FLAG_TSYNC != 0 {
+	// The only flags we support now are SECCOMP_FILTER_FLAG_TSYNC and
+	// SECCOMP_FILTER_FLAG_NEW_LISTENER.
+	if flags&^(linux.SECCOMP_FILTER_FLAG_TSYNC|linux.SECCOMP_FILTER_FLAG_NEW_LISTENER) != 0 {
 		// Unsupported flag.
-		return linuxerr.EINVAL
+		return 0, linuxerr.EINVAL
+	}
+	// As in Linux, both flags can't be used together since their return
+	// values would be ambiguous (without SECCOMP_FILTER_FLAG_TSYNC_ESRCH,
+	// which isn't supported).
+	if tsync && newListener {
+		return 0, linuxerr.EINVAL
 	}
 
 	var fprog userSockFprog
 	if _, err := fprog.CopyIn(t, addr); err != nil {
-		return err
+		return 0, err
 	}
 	filter := make([]linux.BPFInstruction, int(fprog.Len))
 	if _, err := linux.CopyBPFInstructionSliceIn(t, hostarch.Addr(fprog.Filter), filter); err != nil {
-		return err
+		return 0, err
 	}
 	compiledFilter, err := bpf.Compile(filter)
 	if err != nil {
 		t.Debugf("Invalid seccomp-bpf filter: %v", err)
-		return linuxerr.EINVAL
+		return 0, linuxerr.EINVAL
+	}
+
+	if !newListener {
+		return 0, t.AppendSyscallFilter(compiledFilter, tsync, nil)
 	}
 
-	return t.AppendSyscallFilter(compiledFilter, tsync)
+	file, listener, err := kernel.NewSeccompListener(t, t.Kernel().VFS())
+	if err != nil {
+		return 0, err
+	}
+	defer file.DecRef(t)
+	// The listener file descriptor is always close-on-exec, as in Linux.
+	fd, err := t.NewFDFromVFS2(0, file, kernel.FDFlags{
+		CloseOnExec: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := t.AppendSyscallFilter(compiledFilter, tsync, listener); err != nil {
+		if _, file := t.FDTable().Remove(t, fd); file != nil {
+			file.DecRef(t)
+		}
+		return 0, err
+	}
+	return uintptr(fd), nil
 }
 
 // Seccomp implements linux syscall seccomp(2).
 func Seccomp(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return 0, nil, seccomp(t, args[0].Uint64(), args[1].Uint64(), args[2].Pointer())
+	fd, err := seccomp(t, args[0].Uint64(), args[1].Uint64(), args[2].Pointer())
+	return fd, nil, err
 }
@@ -97,13 +97,33 @@ func Shmctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	r := t.IPCNamespace().ShmRegistry()
 
 	switch cmd {
-	case linux.SHM_STAT:
+	case linux.SHM_STAT, linux.SHM_STAT_ANY:
 		// Technically, we should be treating id as "an index into the kernel's
 		// internal array that maintains information about all shared memory
 		// segments on the system". Since we don't track segments in an array,
 		// we'll just pretend the shmid is the index and do the same thing as
 		// IPC_STAT. Linux also uses the index as the shmid.
-		fallthrough
+		segment, err := findSegment(t, id)
+		if err != nil {
+			return 0, nil, linuxerr.EINVAL
+		}
+		defer segment.DecRef(t)
+
+		var stat *linux.ShmidDS
+		if cmd == linux.SHM_STAT {
+			stat, err = segment.IPCStat(t)
+		} else {
+			stat, err = segment.IPCStatAny(t)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if _, err := stat.CopyOut(t, buf); err != nil {
+			return 0, nil, err
+		}
+		// SHM_STAT and SHM_STAT_ANY return the shmid of the segment.
+		return uintptr(segment.ID()), nil, nil
+
 	case linux.IPC_STAT:
 		segment, err := findSegment(t, id)
 		if err != nil {
@@ -119,13 +139,17 @@ func Shmctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 
 	case linux.IPC_INFO:
 		params := r.IPCInfo()
-		_, err := params.CopyOut(t, buf)
-		return 0, nil, err
+		if _, err := params.CopyOut(t, buf); err != nil {
+			return 0, nil, err
+		}
+		return uintptr(r.HighestIndex()), nil, nil
 
 	case linux.SHM_INFO:
 		info := r.ShmInfo()
-		_, err := info.CopyOut(t, buf)
-		return 0, nil, err
+		if _, err := info.CopyOut(t, buf); err != nil {
+			return 0, nil, err
+		}
+		return uintptr(r.HighestIndex()), nil, nil
 	}
 
 	// Remaining commands refer to a specific segment.
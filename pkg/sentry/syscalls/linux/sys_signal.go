@@ -528,9 +528,13 @@ func sharedSignalfd(t *kernel.Task, fd int32, sigset hostarch.Addr, sigsetsize u
 		return 0, nil, linuxerr.EINVAL
 	}
 
+	// SIGKILL and SIGSTOP can't be read from a signalfd.
+	mask &^= kernel.UnblockableSignals
+
 	// Is this a change to an existing signalfd?
 	//
-	// The spec indicates that this should adjust the mask.
+	// The spec indicates that this should adjust the mask. As in Linux, the
+	// flags of the existing file and descriptor are left unchanged.
 	if fd != -1 {
 		file := t.GetFile(fd)
 		if file == nil {
@@ -541,7 +545,7 @@ func sharedSignalfd(t *kernel.Task, fd int32, sigset hostarch.Addr, sigsetsize u
 		// Is this a signalfd?
 		if s, ok := file.FileOperations.(*signalfd.SignalOperations); ok {
 			s.SetMask(mask)
-			return 0, nil, nil
+			return uintptr(fd), nil, nil
 		}
 
 		// Not a signalfd.
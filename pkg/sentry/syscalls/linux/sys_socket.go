@@ -924,7 +924,7 @@ func SendMsg(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 	}
 
 	// Reject flags that we don't handle yet.
-	if flags & ^(linux.MSG_DONTWAIT|linux.MSG_EOR|linux.MSG_MORE|linux.MSG_NOSIGNAL) != 0 {
+	if flags & ^(linux.MSG_DONTWAIT|linux.MSG_EOR|linux.MSG_FASTOPEN|linux.MSG_MORE|linux.MSG_NOSIGNAL|linux.MSG_ZEROCOPY) != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -966,7 +966,7 @@ func SendMMsg(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 	}
 
 	// Reject flags that we don't handle yet.
-	if flags & ^(linux.MSG_DONTWAIT|linux.MSG_EOR|linux.MSG_MORE|linux.MSG_NOSIGNAL) != 0 {
+	if flags & ^(linux.MSG_DONTWAIT|linux.MSG_EOR|linux.MSG_FASTOPEN|linux.MSG_MORE|linux.MSG_NOSIGNAL|linux.MSG_ZEROCOPY) != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -108,6 +108,11 @@ func execveat(t *kernel.Task, dirFD int32, pathnameAddr, argvAddr, envvAddr host
 	if flags&^(linux.AT_EMPTY_PATH|linux.AT_SYMLINK_NOFOLLOW) != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
+
+	// See Linux's fs/exec.c:do_execveat_common().
+	if err := t.CheckRLimitNProcForExec(); err != nil {
+		return 0, nil, err
+	}
 	atEmptyPath := flags&linux.AT_EMPTY_PATH != 0
 	if !atEmptyPath && len(pathname) == 0 {
 		return 0, nil, linuxerr.ENOENT
@@ -196,6 +201,10 @@ func ExitGroup(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 
 // clone is used by Clone, Fork, and VFork.
 func clone(t *kernel.Task, flags int, stack hostarch.Addr, parentTID hostarch.Addr, childTID hostarch.Addr, tls hostarch.Addr) (uintptr, *kernel.SyscallControl, error) {
+	// clone(2) returns the pidfd in place of the parent TID.
+	if flags&linux.CLONE_PIDFD != 0 && flags&linux.CLONE_PARENT_SETTID != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
 	args := linux.CloneArgs{
 		Flags:      uint64(uint32(flags) &^ linux.CSIGNAL),
 		Pidfd:      uint64(parentTID),
@@ -209,6 +218,73 @@ func clone(t *kernel.Task, flags int, stack hostarch.Addr, parentTID hostarch.Ad
 	return uintptr(ntid), ctrl, err
 }
 
+// clone3Flags is the set of flags supported by clone3(2). Unlike clone(2),
+// clone3(2) rejects CLONE_DETACHED, and the exit signal is passed separately.
+const clone3Flags = 0xffffffff&^(linux.CSIGNAL|linux.CLONE_DETACHED) | linux.CLONE_NEWTIME | linux.CLONE_CLEAR_SIGHAND
+
+// Clone3 implements linux syscall clone3(2).
+func Clone3(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+	size := args[1].SizeT()
+
+	if size < linux.CLONE_ARGS_SIZE_VER0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if size > hostarch.PageSize {
+		return 0, nil, linuxerr.E2BIG
+	}
+	// Newer versions of struct clone_args may be passed only if the fields
+	// that we don't know about are zero.
+	var cloneArgs linux.CloneArgs
+	buf := make([]byte, size)
+	if uint(len(buf)) < uint(cloneArgs.SizeBytes()) {
+		buf = make([]byte, cloneArgs.SizeBytes())
+	}
+	if _, err := t.CopyInBytes(addr, buf[:size]); err != nil {
+		return 0, nil, err
+	}
+	for _, b := range buf[cloneArgs.SizeBytes():] {
+		if b != 0 {
+			return 0, nil, linuxerr.E2BIG
+		}
+	}
+	cloneArgs.UnmarshalBytes(buf)
+
+	if cloneArgs.Flags&^clone3Flags != 0 {
+		// Notably, setting the TID of the child with set_tid and
+		// CLONE_INTO_CGROUP are not supported.
+		return 0, nil, linuxerr.EINVAL
+	}
+	if cloneArgs.SetTID != 0 || cloneArgs.SetTIDSize != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if cloneArgs.ExitSignal&^linux.CSIGNAL != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if cloneArgs.Flags&(linux.CLONE_SIGHAND|linux.CLONE_CLEAR_SIGHAND) == linux.CLONE_SIGHAND|linux.CLONE_CLEAR_SIGHAND {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if cloneArgs.Flags&(linux.CLONE_THREAD|linux.CLONE_PARENT) != 0 && cloneArgs.ExitSignal != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Unlike clone(2), clone3(2) takes the lowest address of the stack, and
+	// its size.
+	if (cloneArgs.Stack == 0) != (cloneArgs.StackSize == 0) {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if cloneArgs.Stack != 0 {
+		end, ok := hostarch.Addr(cloneArgs.Stack).AddLength(cloneArgs.StackSize)
+		if !ok {
+			return 0, nil, linuxerr.EINVAL
+		}
+		cloneArgs.Stack = uint64(end)
+		cloneArgs.StackSize = 0
+	}
+
+	ntid, ctrl, err := t.Clone(&cloneArgs)
+	return uintptr(ntid), ctrl, err
+}
+
 // Fork implements Linux syscall fork(2).
 func Fork(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	// "A call to fork() is equivalent to a call to clone(2) specifying flags
@@ -351,6 +427,21 @@ func Waitid(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 		wopts.SpecificTID = kernel.ThreadID(id)
 	case linux.P_PGID:
 		wopts.SpecificPGID = kernel.ProcessGroupID(id)
+	case linux.P_PIDFD:
+		tg, flags, err := getPIDFD(t, id)
+		if err != nil {
+			return 0, nil, err
+		}
+		// If tg has been reaped, it's not a child anymore, even if its TID
+		// has been reused.
+		tid := t.PIDNamespace().IDOfThreadGroup(tg)
+		if tid == 0 {
+			return 0, nil, linuxerr.ECHILD
+		}
+		wopts.SpecificTID = tid
+		if flags&linux.O_NONBLOCK != 0 {
+			options |= linux.WNOHANG
+		}
 	default:
 		return 0, nil, linuxerr.EINVAL
 	}
@@ -731,5 +822,6 @@ func Ptrace(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	addr := args[2].Pointer()
 	data := args[3].Pointer()
 
-	return 0, nil, t.Ptrace(req, pid, addr, data)
+	n, err := t.Ptrace(req, pid, addr, data)
+	return n, nil, err
 }
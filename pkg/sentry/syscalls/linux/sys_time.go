@@ -91,6 +91,12 @@ type cpuClocker interface {
 	CPUClock() ktime.Clock
 }
 
+// isAlarmClock returns true if clockID is one of the alarm clocks, which
+// require CAP_WAKE_ALARM to create timers.
+func isAlarmClock(clockID int32) bool {
+	return clockID == linux.CLOCK_REALTIME_ALARM || clockID == linux.CLOCK_BOOTTIME_ALARM
+}
+
 func getClock(t *kernel.Task, clockID int32) (ktime.Clock, error) {
 	if clockID < 0 {
 		if !isValidCPUClock(clockID) {
@@ -121,18 +127,26 @@ func getClock(t *kernel.Task, clockID int32) (ktime.Clock, error) {
 	}
 
 	switch clockID {
-	case linux.CLOCK_REALTIME, linux.CLOCK_REALTIME_COARSE:
+	case linux.CLOCK_REALTIME, linux.CLOCK_REALTIME_COARSE, linux.CLOCK_REALTIME_ALARM:
+		// CLOCK_REALTIME_ALARM is mapped to CLOCK_REALTIME, since the sandbox
+		// can't wake the host from suspend.
 		return t.Kernel().RealtimeClock(), nil
-	case linux.CLOCK_MONOTONIC, linux.CLOCK_MONOTONIC_COARSE,
-		linux.CLOCK_MONOTONIC_RAW, linux.CLOCK_BOOTTIME:
+	case linux.CLOCK_MONOTONIC, linux.CLOCK_MONOTONIC_COARSE, linux.CLOCK_MONOTONIC_RAW:
 		// CLOCK_MONOTONIC approximates CLOCK_MONOTONIC_RAW.
-		// CLOCK_BOOTTIME is internally mapped to CLOCK_MONOTONIC, as:
+		return t.TimeNamespace().MonotonicClock(), nil
+	case linux.CLOCK_BOOTTIME, linux.CLOCK_BOOTTIME_ALARM:
+		// CLOCK_BOOTTIME is internally based on CLOCK_MONOTONIC, as:
 		//	- CLOCK_BOOTTIME should behave as CLOCK_MONOTONIC while also
 		//		including suspend time.
 		//	- gVisor has no concept of suspend/resume.
 		//	- CLOCK_MONOTONIC already includes save/restore time, which is
-		//		the closest to suspend time.
-		return t.Kernel().MonotonicClock(), nil
+		//		the closest to suspend time. Timers using it are resumed
+		//		against the adjusted time after restore, so they fire
+		//		once for each period that elapsed during downtime.
+		// The two clocks differ only in their time namespace offsets.
+		// CLOCK_BOOTTIME_ALARM is mapped to CLOCK_BOOTTIME, like
+		// CLOCK_REALTIME_ALARM.
+		return t.TimeNamespace().BoottimeClock(), nil
 	case linux.CLOCK_PROCESS_CPUTIME_ID:
 		return t.ThreadGroup().CPUClock(), nil
 	case linux.CLOCK_THREAD_CPUTIME_ID:
@@ -147,6 +161,9 @@ func ClockGettime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 	clockID := int32(args[0].Int())
 	addr := args[1].Pointer()
 
+	// In virtual time, reading the clock lets time pass.
+	t.Kernel().Timekeeper().AdvanceQuantum()
+
 	c, err := getClock(t, clockID)
 	if err != nil {
 		return 0, nil, err
@@ -156,14 +173,40 @@ func ClockGettime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 }
 
 // ClockSettime implements linux syscall clock_settime(2).
-func ClockSettime(*kernel.Task, arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return 0, nil, linuxerr.EPERM
+func ClockSettime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	clockID := int32(args[0].Int())
+	addr := args[1].Pointer()
+
+	// Only CLOCK_REALTIME can be set, as in Linux.
+	if clockID != linux.CLOCK_REALTIME {
+		return 0, nil, linuxerr.EINVAL
+	}
+	ts, err := copyTimespecIn(t, addr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !ts.Valid() || ts.Sec < 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	return 0, nil, setRealtime(t, ktime.FromTimespec(ts))
+}
+
+// setRealtime sets the sandbox's CLOCK_REALTIME. The host's clock is not
+// affected.
+func setRealtime(t *kernel.Task, now ktime.Time) error {
+	// CLOCK_REALTIME isn't namespaced, so CAP_SYS_TIME is required in the
+	// root user namespace, as in Linux.
+	if !t.Credentials().HasCapabilityIn(linux.CAP_SYS_TIME, t.Kernel().RootUserNamespace()) {
+		return linuxerr.EPERM
+	}
+	return t.Kernel().Timekeeper().SetRealtime(now)
 }
 
 // Time implements linux syscall time(2).
 func Time(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
 
+	t.Kernel().Timekeeper().AdvanceQuantum()
 	r := t.Kernel().RealtimeClock().Now().TimeT()
 	if addr == hostarch.Addr(0) {
 		return uintptr(r), nil, nil
@@ -218,6 +261,8 @@ func ClockNanosleep(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kerne
 		if clockID != linux.CLOCK_REALTIME &&
 			clockID != linux.CLOCK_MONOTONIC &&
 			clockID != linux.CLOCK_BOOTTIME &&
+			clockID != linux.CLOCK_REALTIME_ALARM &&
+			clockID != linux.CLOCK_BOOTTIME_ALARM &&
 			clockID != linux.CLOCK_PROCESS_CPUTIME_ID {
 			return 0, nil, linuxerr.EINVAL
 		}
@@ -232,6 +277,11 @@ func ClockNanosleep(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kerne
 		return 0, nil, clockNanosleepUntil(t, c, ktime.FromTimespec(req), 0, false)
 	}
 
+	// Relative sleeps are unaffected by changes to CLOCK_REALTIME, so they
+	// use CLOCK_MONOTONIC as in Linux's kernel/time/hrtimer.c:__hrtimer_init().
+	if c == t.Kernel().RealtimeClock() {
+		c = t.Kernel().MonotonicClock()
+	}
 	dur := time.Duration(req.ToNsecCapped()) * time.Nanosecond
 	return 0, nil, clockNanosleepUntil(t, c, c.Now().Add(dur), rem, true)
 }
@@ -304,12 +354,48 @@ func (n *clockNanosleepRestartBlock) Restart(t *kernel.Task) (uintptr, error) {
 	return 0, clockNanosleepUntil(t, n.c, n.end, n.rem, true)
 }
 
+// Settimeofday implements linux syscall settimeofday(2).
+func Settimeofday(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	tv := args[0].Pointer()
+	tz := args[1].Pointer()
+
+	var now linux.Timeval
+	if tv != hostarch.Addr(0) {
+		var err error
+		if now, err = copyTimevalIn(t, tv); err != nil {
+			return 0, nil, err
+		}
+		if now.Sec < 0 || now.Usec < 0 || now.Usec >= 1e6 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+	if tz != hostarch.Addr(0) {
+		// The timezone is taken from the host, so it can't be changed. Its
+		// argument is only validated.
+		var minutesWest primitive.Int32
+		if _, err := minutesWest.CopyIn(t, tz); err != nil {
+			return 0, nil, err
+		}
+		if minutesWest < -15*60 || minutesWest > 15*60 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+	if tv == hostarch.Addr(0) {
+		if !t.Credentials().HasCapabilityIn(linux.CAP_SYS_TIME, t.Kernel().RootUserNamespace()) {
+			return 0, nil, linuxerr.EPERM
+		}
+		return 0, nil, nil
+	}
+	return 0, nil, setRealtime(t, ktime.FromTimeval(now))
+}
+
 // Gettimeofday implements linux syscall gettimeofday(2).
 func Gettimeofday(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	tv := args[0].Pointer()
 	tz := args[1].Pointer()
 
 	if tv != hostarch.Addr(0) {
+		t.Kernel().Timekeeper().AdvanceQuantum()
 		nowTv := t.Kernel().RealtimeClock().Now().Timeval()
 		if err := copyTimevalOut(t, tv, &nowTv); err != nil {
 			return 0, nil, err
@@ -109,6 +109,9 @@ func TimerCreate(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.S
 	if err != nil {
 		return 0, nil, err
 	}
+	if isAlarmClock(clockID) && !t.HasCapability(linux.CAP_WAKE_ALARM) {
+		return 0, nil, linuxerr.EPERM
+	}
 
 	var sev *linux.Sigevent
 	if sevp != 0 {
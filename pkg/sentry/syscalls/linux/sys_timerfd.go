@@ -35,13 +35,18 @@ func TimerfdCreate(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel
 
 	var c ktime.Clock
 	switch clockID {
-	case linux.CLOCK_REALTIME:
+	case linux.CLOCK_REALTIME, linux.CLOCK_REALTIME_ALARM:
 		c = t.Kernel().RealtimeClock()
-	case linux.CLOCK_MONOTONIC, linux.CLOCK_BOOTTIME:
-		c = t.Kernel().MonotonicClock()
+	case linux.CLOCK_MONOTONIC:
+		c = t.TimeNamespace().MonotonicClock()
+	case linux.CLOCK_BOOTTIME, linux.CLOCK_BOOTTIME_ALARM:
+		c = t.TimeNamespace().BoottimeClock()
 	default:
 		return 0, nil, linuxerr.EINVAL
 	}
+	if isAlarmClock(clockID) && !t.HasCapability(linux.CAP_WAKE_ALARM) {
+		return 0, nil, linuxerr.EPERM
+	}
 	f := timerfd.NewFile(t, c)
 	defer f.DecRef(t)
 	f.SetFlags(fs.SettableFileFlags{
@@ -34,11 +34,22 @@ func Uname(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	copy(u.Release[:], version.Release)
 	copy(u.Version[:], version.Version)
 	// build tag above.
+	// Like Linux, report the 32-bit machine to tasks with the PER_LINUX32
+	// personality.
+	linux32 := t.Personality()&linux.PER_MASK == linux.PER_LINUX32
 	switch t.SyscallTable().Arch {
 	case arch.AMD64:
-		copy(u.Machine[:], "x86_64")
+		if linux32 {
+			copy(u.Machine[:], "i686")
+		} else {
+			copy(u.Machine[:], "x86_64")
+		}
 	case arch.ARM64:
-		copy(u.Machine[:], "aarch64")
+		if linux32 {
+			copy(u.Machine[:], "armv8l")
+		} else {
+			copy(u.Machine[:], "aarch64")
+		}
 	default:
 		copy(u.Machine[:], "unknown")
 	}
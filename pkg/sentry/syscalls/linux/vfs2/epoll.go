@@ -142,16 +142,20 @@ func waitEpoll(t *kernel.Task, epfd int32, eventsAddr hostarch.Addr, maxEvents i
 		ch           chan struct{}
 		haveDeadline bool
 		deadline     ktime.Time
+		busyPolled   bool
 	)
 	for {
-		events := ep.ReadEvents(eventsArr[:0], maxEvents)
-		if len(events) != 0 {
-			copiedBytes, err := linux.CopyEpollEventSliceOut(t, eventsAddr, events)
-			copiedEvents := copiedBytes / sizeofEpollEvent // rounded down
-			if copiedEvents != 0 {
-				return uintptr(copiedEvents), nil, nil
-			}
-			return 0, nil, err
+		var copyErr error
+		copiedEvents := ep.ReadEvents(eventsArr[:], maxEvents, func(events []linux.EpollEvent) int {
+			var copiedBytes int
+			copiedBytes, copyErr = linux.CopyEpollEventSliceOut(t, eventsAddr, events)
+			return copiedBytes / sizeofEpollEvent // rounded down
+		})
+		if copiedEvents != 0 {
+			return uintptr(copiedEvents), nil, nil
+		}
+		if copyErr != nil {
+			return 0, nil, copyErr
 		}
 		if timeoutInNanos == 0 {
 			return 0, nil, nil
@@ -168,6 +172,11 @@ func waitEpoll(t *kernel.Task, epfd int32, eventsAddr hostarch.Addr, maxEvents i
 				return 0, nil, err
 			}
 			defer epfile.EventUnregister(&w)
+		} else if !busyPolled {
+			// Busy poll before the first sleep, if
+			// /proc/sys/net/core/busy_poll is set.
+			busyPolled = true
+			t.BusyPoll(t.Kernel().NetBusyPoll(), ep.MaybeReady)
 		} else {
 			// Set up the timer if a timeout was specified.
 			if timeoutInNanos > 0 && !haveDeadline {
@@ -208,7 +217,7 @@ func EpollPwait(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sy
 	return EpollWait(t, args)
 }
 
-// EpollPwait2 implements Linux syscall epoll_pwait(2).
+// EpollPwait2 implements Linux syscall epoll_pwait2(2).
 func EpollPwait2(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	epfd := args[0].Int()
 	eventsAddr := args[1].Pointer()
@@ -224,7 +233,10 @@ func EpollPwait2(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.S
 		if _, err := timeout.CopyIn(t, timeoutPtr); err != nil {
 			return 0, nil, err
 		}
-		timeoutInNanos = timeout.ToNsec()
+		if !timeout.Valid() {
+			return 0, nil, linuxerr.EINVAL
+		}
+		timeoutInNanos = timeout.ToNsecCapped()
 	}
 
 	if err := setTempSignalSet(t, maskAddr, maskSize); err != nil {
@@ -51,6 +51,11 @@ func execveat(t *kernel.Task, dirfd int32, pathnameAddr, argvAddr, envvAddr host
 		return 0, nil, linuxerr.EINVAL
 	}
 
+	// See Linux's fs/exec.c:do_execveat_common().
+	if err := t.CheckRLimitNProcForExec(); err != nil {
+		return 0, nil, err
+	}
+
 	pathname, err := t.CopyInString(pathnameAddr, linux.PATH_MAX)
 	if err != nil {
 		return 0, nil, err
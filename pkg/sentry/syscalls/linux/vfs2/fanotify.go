@@ -0,0 +1,166 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs2
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+const fanotifyMarkFlags = linux.FAN_MARK_ADD | linux.FAN_MARK_REMOVE | linux.FAN_MARK_DONT_FOLLOW |
+	linux.FAN_MARK_ONLYDIR | linux.FAN_MARK_IGNORED_MASK | linux.FAN_MARK_IGNORED_SURV_MODIFY |
+	linux.FAN_MARK_FLUSH | linux.FAN_MARK_MOUNT
+
+// FanotifyInit implements the fanotify_init() syscall.
+func FanotifyInit(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	flags := args[0].Uint()
+	eventFlags := args[1].Uint()
+
+	if !t.HasCapability(linux.CAP_SYS_ADMIN) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	fan, err := vfs.NewFanotifyFD(t, t.Kernel().VFS(), flags, eventFlags)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer fan.DecRef(t)
+
+	fd, err := t.NewFDFromVFS2(0, fan, kernel.FDFlags{
+		CloseOnExec: flags&linux.FAN_CLOEXEC != 0,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return uintptr(fd), nil, nil
+}
+
+// fdToFanotify resolves an fd to a fanotify object. If successful, the file
+// will have an extra ref and the caller is responsible for releasing the ref.
+func fdToFanotify(t *kernel.Task, fd int32) (*vfs.Fanotify, *vfs.FileDescription, error) {
+	f := t.GetFileVFS2(fd)
+	if f == nil {
+		// Invalid fd.
+		return nil, nil, linuxerr.EBADF
+	}
+
+	fan, ok := f.Impl().(*vfs.Fanotify)
+	if !ok {
+		// Not a fanotify fd.
+		f.DecRef(t)
+		return nil, nil, linuxerr.EINVAL
+	}
+
+	return fan, f, nil
+}
+
+// FanotifyMark implements the fanotify_mark() syscall.
+func FanotifyMark(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	flags := args[1].Uint()
+	mask := args[2].Uint64()
+	dirfd := args[3].Int()
+	addr := args[4].Pointer()
+
+	if flags&^fanotifyMarkFlags != 0 {
+		// This includes FAN_MARK_FILESYSTEM, which is not supported.
+		return 0, nil, linuxerr.EINVAL
+	}
+	switch flags & (linux.FAN_MARK_ADD | linux.FAN_MARK_REMOVE | linux.FAN_MARK_FLUSH) {
+	case linux.FAN_MARK_ADD, linux.FAN_MARK_REMOVE:
+		if mask == 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	case linux.FAN_MARK_FLUSH:
+		if flags&^(linux.FAN_MARK_MOUNT|linux.FAN_MARK_FLUSH) != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	default:
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Permission events are not reported to FAN_CLASS_NOTIF groups, and other
+	// events are not supported.
+	if mask&^(vfs.FanotifyEvents|linux.FAN_ONDIR|linux.FAN_EVENT_ON_CHILD) != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// VFS does not track the parents of Dentries, so directory marks can't
+	// report events on children. FAN_EVENT_ON_CHILD has no effect on mount
+	// marks.
+	if mask&linux.FAN_EVENT_ON_CHILD != 0 {
+		if flags&linux.FAN_MARK_MOUNT == 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		mask &^= linux.FAN_EVENT_ON_CHILD
+	}
+
+	fan, f, err := fdToFanotify(t, fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.DecRef(t)
+
+	if flags&linux.FAN_MARK_FLUSH != 0 {
+		fan.FlushMarks(t, flags)
+		return 0, nil, nil
+	}
+
+	// "If pathname is NULL, the filesystem object to be marked is determined
+	// by the file descriptor dirfd." - fanotify_mark(2)
+	var path fspath.Path
+	emptyPath := allowEmptyPath
+	if addr != 0 {
+		emptyPath = disallowEmptyPath
+		path, err = copyInPath(t, addr)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	if flags&linux.FAN_MARK_ONLYDIR != 0 {
+		path.Dir = true
+	}
+	follow := followFinalSymlink
+	if flags&linux.FAN_MARK_DONT_FOLLOW != 0 {
+		follow = nofollowFinalSymlink
+	}
+	tpop, err := getTaskPathOperation(t, dirfd, path, emptyPath, follow)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tpop.Release(t)
+	vd, err := t.Kernel().VFS().GetDentryAt(t, t.Credentials(), &tpop.pop, &vfs.GetDentryOptions{})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer vd.DecRef(t)
+
+	// As in Linux's fs/notify/fanotify/fanotify_user.c:fanotify_find_path(),
+	// the caller must be able to read the object being marked.
+	if err := t.Kernel().VFS().AccessAt(t, t.Credentials(), vfs.MayRead, &vfs.PathOperation{
+		Root:  vd,
+		Start: vd,
+	}); err != nil {
+		return 0, nil, err
+	}
+
+	if flags&linux.FAN_MARK_ADD != 0 {
+		return 0, nil, fan.AddMark(vd, flags, mask)
+	}
+	return 0, nil, fan.RemoveMark(t, vd, flags, mask)
+}
@@ -19,12 +19,15 @@ import (
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fs/lock"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/tmpfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/fasync"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/pipe"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	slinux "gvisor.dev/gvisor/pkg/sentry/syscalls/linux"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
@@ -191,6 +194,11 @@ func Fcntl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	switch cmd {
 	case linux.F_DUPFD, linux.F_DUPFD_CLOEXEC:
 		minfd := args[2].Int()
+		// Unlike the other dup variants, F_DUPFD reports a minimum beyond
+		// RLIMIT_NOFILE as EINVAL. See Linux's fs/fcntl.c:f_dupfd().
+		if lim := limits.FromContext(t).Get(limits.NumberOfFiles); lim.Cur != limits.Infinity && uint64(minfd) >= lim.Cur {
+			return 0, nil, linuxerr.EINVAL
+		}
 		fd, err := t.NewFDFromVFS2(minfd, file, kernel.FDFlags{
 			CloseOnExec: cmd == linux.F_DUPFD_CLOEXEC,
 		})
@@ -446,9 +454,11 @@ func posixLock(t *kernel.Task, args arch.SyscallArguments, file *vfs.FileDescrip
 }
 
 // Fadvise64 implements fadvise64(2).
-// This implementation currently ignores the provided advice.
+// Advice is only acted on by files that support it; see
+// vfs.FileDescription.Fadvise.
 func Fadvise64(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	fd := args[0].Int()
+	offset := args[1].Int64()
 	length := args[2].Int64()
 	advice := args[3].Int()
 
@@ -483,6 +493,63 @@ func Fadvise64(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 		return 0, nil, linuxerr.EINVAL
 	}
 
-	// Sure, whatever.
-	return 0, nil, nil
+	return 0, nil, file.Fadvise(t, offset, length, advice)
+}
+
+// Cachestat implements Linux syscall cachestat(2).
+func Cachestat(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	rangeAddr := args[1].Pointer()
+	statAddr := args[2].Pointer()
+	flags := args[3].Uint()
+
+	file := t.GetFileVFS2(fd)
+	if file == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+
+	if file.StatusFlags()&linux.O_PATH != 0 {
+		return 0, nil, linuxerr.EBADF
+	}
+
+	var csr linux.CachestatRange
+	if _, err := csr.CopyIn(t, rangeAddr); err != nil {
+		return 0, nil, err
+	}
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	// A length of 0 means the rest of the file.
+	mr := memmap.MappableRange{
+		Start: hostarch.PageRoundDown(csr.Off),
+		End:   hostarch.PageRoundDown(uint64(math.MaxUint64)),
+	}
+	if csr.Len != 0 {
+		last := csr.Off + csr.Len - 1
+		if last < csr.Off {
+			// As in Linux, the range is empty if it overflows.
+			mr.End = mr.Start
+		} else if end, ok := hostarch.PageRoundUp(last + 1); ok && end != 0 {
+			mr.End = end
+		}
+	}
+
+	var cs memmap.CacheStat
+	if mr.Start < mr.End {
+		var err error
+		if cs, err = file.CacheStat(t, mr); err != nil {
+			return 0, nil, err
+		}
+	}
+	stat := linux.Cachestat{
+		NrCache:           cs.Cache,
+		NrDirty:           cs.Dirty,
+		NrWriteback:       cs.Writeback,
+		NrEvicted:         cs.Evicted,
+		NrRecentlyEvicted: cs.RecentlyEvicted,
+	}
+	_, err := stat.CopyOut(t, statAddr)
+	return 0, nil, err
 }
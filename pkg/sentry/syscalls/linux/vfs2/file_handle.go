@@ -0,0 +1,139 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs2
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// NameToHandleAt implements Linux syscall name_to_handle_at(2).
+func NameToHandleAt(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	dirfd := args[0].Int()
+	pathAddr := args[1].Pointer()
+	handleAddr := args[2].Pointer()
+	mountIDAddr := args[3].Pointer()
+	flags := args[4].Int()
+
+	if flags&^(linux.AT_SYMLINK_FOLLOW|linux.AT_EMPTY_PATH|linux.AT_HANDLE_FID) != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	var hdr linux.FileHandle
+	if _, err := hdr.CopyIn(t, handleAddr); err != nil {
+		return 0, nil, err
+	}
+	if hdr.HandleBytes > linux.MAX_HANDLE_SZ {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	path, err := copyInPath(t, pathAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	tpop, err := getTaskPathOperation(t, dirfd, path, shouldAllowEmptyPath(flags&linux.AT_EMPTY_PATH != 0), shouldFollowFinalSymlink(flags&linux.AT_SYMLINK_FOLLOW != 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tpop.Release(t)
+
+	fh, mountID, err := t.Kernel().VFS().NameToHandleAt(t, t.Credentials(), &tpop.pop)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// As in Linux, if the handle doesn't fit in the caller's buffer, only
+	// the required size is copied out, along with the mount ID.
+	var retErr error
+	var b []byte
+	if uint32(len(fh.Bytes)) > hdr.HandleBytes {
+		retErr = linuxerr.EOVERFLOW
+	} else {
+		b = fh.Bytes
+		hdr.HandleType = fh.Type
+	}
+	hdr.HandleBytes = uint32(len(fh.Bytes))
+	if _, err := primitive.CopyInt32Out(t, mountIDAddr, int32(mountID)); err != nil {
+		return 0, nil, err
+	}
+	if _, err := hdr.CopyOut(t, handleAddr); err != nil {
+		return 0, nil, err
+	}
+	if _, err := t.CopyOutBytes(handleAddr+hostarch.Addr(hdr.SizeBytes()), b); err != nil {
+		return 0, nil, err
+	}
+	return 0, nil, retErr
+}
+
+// OpenByHandleAt implements Linux syscall open_by_handle_at(2).
+func OpenByHandleAt(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	mountfd := args[0].Int()
+	handleAddr := args[1].Pointer()
+	flags := args[2].Uint()
+
+	// Opening a file by handle bypasses permission checks on the path to
+	// the file, so it is restricted as in fs/fhandle.c:may_decode_fh().
+	if !t.HasCapabilityIn(linux.CAP_DAC_READ_SEARCH, t.MountNamespaceVFS2().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	var hdr linux.FileHandle
+	if _, err := hdr.CopyIn(t, handleAddr); err != nil {
+		return 0, nil, err
+	}
+	if hdr.HandleBytes == 0 || hdr.HandleBytes > linux.MAX_HANDLE_SZ {
+		return 0, nil, linuxerr.EINVAL
+	}
+	b := make([]byte, hdr.HandleBytes)
+	if _, err := t.CopyInBytes(handleAddr+hostarch.Addr(hdr.SizeBytes()), b); err != nil {
+		return 0, nil, err
+	}
+
+	var mntVD vfs.VirtualDentry
+	if mountfd == linux.AT_FDCWD {
+		mntVD = t.FSContext().WorkingDirectoryVFS2()
+	} else {
+		mntFile := t.GetFileVFS2(mountfd)
+		if mntFile == nil {
+			return 0, nil, linuxerr.EBADF
+		}
+		mntVD = mntFile.VirtualDentry()
+		mntVD.IncRef()
+		mntFile.DecRef(t)
+	}
+	defer mntVD.DecRef(t)
+	root := t.FSContext().RootDirectoryVFS2()
+	defer root.DecRef(t)
+
+	file, err := t.Kernel().VFS().OpenByHandleAt(t, t.Credentials(), root, mntVD, vfs.FileHandle{
+		Type:  hdr.HandleType,
+		Bytes: b,
+	}, &vfs.OpenOptions{
+		Flags: flags | linux.O_LARGEFILE,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	fd, err := t.NewFDFromVFS2(0, file, kernel.FDFlags{
+		CloseOnExec: flags&linux.O_CLOEXEC != 0,
+	})
+	return uintptr(fd), nil, err
+}
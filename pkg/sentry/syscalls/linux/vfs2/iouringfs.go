@@ -83,39 +83,115 @@ func IOUringEnter(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.
 	flags := uint32(args[3].Uint())
 	sigSet := args[4].Pointer()
 
-	ret := -1
-
 	// List of currently supported flags for io_uring_enter(2).
-	const supportedFlags = 0 // Currently support none
+	const supportedFlags = linux.IORING_ENTER_GETEVENTS
 
 	// Since we don't implement everything, we fail explicitly on flags that are unimplemented.
 	if flags|supportedFlags != supportedFlags {
-		return uintptr(ret), nil, linuxerr.EINVAL
+		return 0, nil, linuxerr.EINVAL
 	}
 
 	// Currently don't support replacing an existing signal mask.
 	if sigSet != hostarch.Addr(0) {
-		return uintptr(ret), nil, linuxerr.EFAULT
-	}
-
-	// If a user requested to submit zero SQEs, then we don't process any and return right away.
-	if toSubmit == 0 {
-		return uintptr(ret), nil, nil
+		return 0, nil, linuxerr.EFAULT
 	}
 
 	file := t.GetFileVFS2(fd)
 	if file == nil {
-		return uintptr(ret), nil, linuxerr.EBADF
+		return 0, nil, linuxerr.EBADF
 	}
 	defer file.DecRef(t)
 	iouringfd, ok := file.Impl().(*iouringfs.FileDescription)
 	if !ok {
-		return uintptr(ret), nil, linuxerr.EBADF
+		return 0, nil, linuxerr.EBADF
 	}
-	ret, err := iouringfd.ProcessSubmissions(toSubmit, minComplete, flags)
-	if err != nil {
-		return uintptr(ret), nil, err
+
+	ret := 0
+	if toSubmit != 0 {
+		var err error
+		ret, err = iouringfd.ProcessSubmissions(t, toSubmit)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if flags&linux.IORING_ENTER_GETEVENTS != 0 {
+		// As in Linux, errors while waiting are only reported if no
+		// submissions were consumed.
+		if err := iouringfd.WaitCompletions(t, minComplete); err != nil && ret == 0 {
+			return 0, nil, err
+		}
 	}
 
 	return uintptr(ret), nil, nil
 }
+
+// IOUringRegister implements linux syscall io_uring_register(2).
+func IOUringRegister(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := int32(args[0].Int())
+	opcode := args[1].Uint()
+	arg := args[2].Pointer()
+	nrArgs := args[3].Uint()
+
+	file := t.GetFileVFS2(fd)
+	if file == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer file.DecRef(t)
+	if _, ok := file.Impl().(*iouringfs.FileDescription); !ok {
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+
+	switch opcode {
+	case linux.IORING_REGISTER_PROBE:
+		return 0, nil, ioUringProbe(t, arg, nrArgs)
+	default:
+		// Registered buffers and files, among others, are not supported.
+		return 0, nil, linuxerr.EINVAL
+	}
+}
+
+// ioUringProbe implements IORING_REGISTER_PROBE, which reports the supported
+// opcodes in a struct io_uring_probe with room for nrOps opcodes at addr. See
+// io_uring/io_uring.c:io_probe().
+func ioUringProbe(t *kernel.Task, addr hostarch.Addr, nrOps uint32) error {
+	if nrOps > linux.IORING_OP_LAST {
+		nrOps = linux.IORING_OP_LAST
+	}
+
+	var probe linux.IOUringProbe
+	if _, err := probe.CopyIn(t, addr); err != nil {
+		return err
+	}
+	ops := make([]linux.IOUringProbeOp, nrOps)
+	opsAddr, ok := addr.AddLength(uint64(probe.SizeBytes()))
+	if !ok {
+		return linuxerr.EFAULT
+	}
+	if _, err := linux.CopyIOUringProbeOpSliceIn(t, opsAddr, ops); err != nil {
+		return err
+	}
+	// The probe must be zeroed by the caller.
+	if probe != (linux.IOUringProbe{}) {
+		return linuxerr.EINVAL
+	}
+	for i := range ops {
+		if ops[i] != (linux.IOUringProbeOp{}) {
+			return linuxerr.EINVAL
+		}
+	}
+
+	probe.LastOp = linux.IORING_OP_LAST - 1
+	probe.OpsLen = uint8(nrOps)
+	for i := range ops {
+		ops[i].Op = uint8(i)
+		if iouringfs.IsSupportedOp(uint8(i)) {
+			ops[i].Flags = linux.IO_URING_OP_SUPPORTED
+		}
+	}
+	if _, err := probe.CopyOut(t, addr); err != nil {
+		return err
+	}
+	_, err := linux.CopyIOUringProbeOpSliceOut(t, opsAddr, ops)
+	return err
+}
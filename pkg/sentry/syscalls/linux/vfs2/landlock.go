@@ -0,0 +1,144 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs2
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// LandlockCreateRuleset implements Linux syscall landlock_create_ruleset(2).
+func LandlockCreateRuleset(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+	size := args[1].SizeT()
+	flags := args[2].Uint()
+
+	if flags == linux.LANDLOCK_CREATE_RULESET_VERSION {
+		if addr != 0 || size != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		return linux.LANDLOCK_ABI_VERSION, nil, nil
+	}
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	var attr linux.LandlockRulesetAttr
+	if size < uint(attr.SizeBytes()) {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if size > hostarch.PageSize {
+		return 0, nil, linuxerr.E2BIG
+	}
+	// Newer versions of struct landlock_ruleset_attr may be passed only if
+	// the fields that we don't know about are zero.
+	buf := make([]byte, size)
+	if _, err := t.CopyInBytes(addr, buf); err != nil {
+		return 0, nil, err
+	}
+	for _, b := range buf[attr.SizeBytes():] {
+		if b != 0 {
+			return 0, nil, linuxerr.E2BIG
+		}
+	}
+	attr.UnmarshalBytes(buf)
+
+	ruleset, err := vfs.NewLandlockRulesetFD(t, t.Kernel().VFS(), attr.HandledAccessFS)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer ruleset.DecRef(t)
+	// Landlock ruleset fds are always close-on-exec, as in Linux.
+	fd, err := t.NewFDFromVFS2(0, ruleset, kernel.FDFlags{
+		CloseOnExec: true,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return uintptr(fd), nil, nil
+}
+
+// fdToLandlockRuleset resolves an fd to a Landlock ruleset. If successful, the
+// file will have an extra ref and the caller is responsible for releasing the
+// ref.
+func fdToLandlockRuleset(t *kernel.Task, fd int32) (*vfs.LandlockRuleset, *vfs.FileDescription, error) {
+	f := t.GetFileVFS2(fd)
+	if f == nil {
+		return nil, nil, linuxerr.EBADF
+	}
+	ruleset, ok := f.Impl().(*vfs.LandlockRuleset)
+	if !ok {
+		f.DecRef(t)
+		return nil, nil, linuxerr.EBADFD
+	}
+	return ruleset, f, nil
+}
+
+// LandlockAddRule implements Linux syscall landlock_add_rule(2).
+func LandlockAddRule(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	rulesetFD := args[0].Int()
+	ruleType := args[1].Int()
+	addr := args[2].Pointer()
+	flags := args[3].Uint()
+
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	ruleset, f, err := fdToLandlockRuleset(t, rulesetFD)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.DecRef(t)
+	if ruleType != linux.LANDLOCK_RULE_PATH_BENEATH {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	// struct landlock_path_beneath_attr is packed, so copy it in by hand.
+	var buf [linux.SizeOfLandlockPathBeneathAttr]byte
+	if _, err := t.CopyInBytes(addr, buf[:]); err != nil {
+		return 0, nil, err
+	}
+	allowedAccess := hostarch.ByteOrder.Uint64(buf[0:8])
+	parentFD := int32(hostarch.ByteOrder.Uint32(buf[8:12]))
+
+	parent := t.GetFileVFS2(parentFD)
+	if parent == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer parent.DecRef(t)
+	return 0, nil, ruleset.AddPathBeneathRule(t, parent, allowedAccess)
+}
+
+// LandlockRestrictSelf implements Linux syscall landlock_restrict_self(2).
+func LandlockRestrictSelf(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	rulesetFD := args[0].Int()
+	flags := args[1].Uint()
+
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Linux requires no_new_privs or CAP_SYS_ADMIN, but no_new_privs is
+	// always set in the sentry; see Task.updateCredsForExecLocked.
+	ruleset, f, err := fdToLandlockRuleset(t, rulesetFD)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.DecRef(t)
+	return 0, nil, t.RestrictLandlock(ruleset.Layer())
+}
@@ -62,3 +62,32 @@ func MemfdCreate(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.S
 
 	return uintptr(fd), nil, nil
 }
+
+// MemfdSecret implements the linux syscall memfd_secret(2).
+func MemfdSecret(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	if !kernel.MemfdSecretEnabled {
+		return 0, nil, linuxerr.ENOSYS
+	}
+
+	flags := args[0].Uint()
+	if flags&^linux.O_CLOEXEC != 0 {
+		// Unknown bits in flags.
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	shmMount := t.Kernel().ShmMount()
+	file, err := tmpfs.NewMemfdSecret(t, t.Credentials(), shmMount)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	fd, err := t.NewFDFromVFS2(0, file, kernel.FDFlags{
+		CloseOnExec: flags&linux.O_CLOEXEC != 0,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return uintptr(fd), nil, nil
+}
@@ -46,8 +46,8 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	}
 
 	// Silently allow MS_NOSUID, since we don't implement set-id bits anyway.
-	const unsupported = linux.MS_REMOUNT | linux.MS_SLAVE |
-		linux.MS_UNBINDABLE | linux.MS_MOVE | linux.MS_REC | linux.MS_NODIRATIME |
+	const unsupported = linux.MS_SLAVE |
+		linux.MS_UNBINDABLE | linux.MS_MOVE | linux.MS_NODIRATIME |
 		linux.MS_STRICTATIME
 
 	// Linux just allows passing any flags to mount(2) - it won't fail when
@@ -56,6 +56,10 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	if flags&(unsupported) != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
+	// MS_REC is only implemented for bind mounts.
+	if flags&linux.MS_REC != 0 && flags&linux.MS_BIND == 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
 
 	// For null-terminated strings related to mount(2), Linux copies in at most
 	// a page worth of data. See fs/namespace.c:copy_mount_string().
@@ -69,6 +73,17 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	}
 	defer target.Release(t)
 
+	if flags&linux.MS_REMOUNT == linux.MS_REMOUNT {
+		data, err := copyInMountData(t, dataAddr)
+		if err != nil {
+			return 0, nil, err
+		}
+		var opts vfs.MountOptions
+		opts.ReadOnly = flags&linux.MS_RDONLY == linux.MS_RDONLY
+		opts.GetFilesystemOptions.Data = data
+		return 0, nil, t.Kernel().VFS().RemountAt(t, creds, &target.pop, flags&linux.MS_BIND == linux.MS_BIND, &opts)
+	}
+
 	if flags&linux.MS_BIND == linux.MS_BIND {
 		var sourcePath fspath.Path
 		sourcePath, err = copyInPath(t, sourceAddr)
@@ -81,7 +96,7 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 			return 0, nil, err
 		}
 		defer sourceTpop.Release(t)
-		_, err = t.Kernel().VFS().BindAt(t, creds, &sourceTpop.pop, &target.pop)
+		_, err = t.Kernel().VFS().BindAt(t, creds, &sourceTpop.pop, &target.pop, flags&linux.MS_REC == linux.MS_REC)
 		return 0, nil, err
 	}
 	const propagationFlags = linux.MS_SHARED | linux.MS_PRIVATE | linux.MS_SLAVE | linux.MS_UNBINDABLE
@@ -103,16 +118,9 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	if err != nil {
 		return 0, nil, err
 	}
-	data := ""
-	if dataAddr != 0 {
-		// In Linux, a full page is always copied in regardless of null
-		// character placement, and the address is passed to each file system.
-		// Most file systems always treat this data as a string, though, and so
-		// do all of the ones we implement.
-		data, err = t.CopyInString(dataAddr, hostarch.PageSize)
-		if err != nil {
-			return 0, nil, err
-		}
+	data, err := copyInMountData(t, dataAddr)
+	if err != nil {
+		return 0, nil, err
 	}
 	var opts vfs.MountOptions
 	if flags&linux.MS_NOATIME == linux.MS_NOATIME {
@@ -135,6 +143,18 @@ func Mount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 	return 0, nil, err
 }
 
+// copyInMountData copies in the data argument of mount(2), which may be null.
+func copyInMountData(t *kernel.Task, dataAddr hostarch.Addr) (string, error) {
+	if dataAddr == 0 {
+		return "", nil
+	}
+	// In Linux, a full page is always copied in regardless of null character
+	// placement, and the address is passed to each file system. Most file
+	// systems always treat this data as a string, though, and so do all of
+	// the ones we implement.
+	return t.CopyInString(dataAddr, hostarch.PageSize)
+}
+
 // Umount2 implements Linux syscall umount2(2).
 func Umount2(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
@@ -170,3 +190,381 @@ func Umount2(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 
 	return 0, nil, t.Kernel().VFS().UmountAt(t, creds, &tpop.pop, &opts)
 }
+
+// OpenTree implements Linux syscall open_tree(2).
+func OpenTree(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	dirfd := args[0].Int()
+	pathAddr := args[1].Pointer()
+	flags := args[2].Uint()
+
+	const validFlags = linux.AT_EMPTY_PATH | linux.AT_NO_AUTOMOUNT | linux.AT_RECURSIVE | linux.AT_SYMLINK_NOFOLLOW | linux.OPEN_TREE_CLONE | linux.OPEN_TREE_CLOEXEC
+	if flags&^validFlags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if flags&(linux.AT_RECURSIVE|linux.OPEN_TREE_CLONE) == linux.AT_RECURSIVE {
+		return 0, nil, linuxerr.EINVAL
+	}
+	clone := flags&linux.OPEN_TREE_CLONE != 0
+	creds := t.Credentials()
+	if clone && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespaceVFS2().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	path, err := copyInPath(t, pathAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	tpop, err := getTaskPathOperation(t, dirfd, path, shouldAllowEmptyPath(flags&linux.AT_EMPTY_PATH != 0), shouldFollowFinalSymlink(flags&linux.AT_SYMLINK_NOFOLLOW == 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tpop.Release(t)
+
+	var file *vfs.FileDescription
+	if clone {
+		mnt, err := t.Kernel().VFS().CloneMountTreeAt(t, creds, &tpop.pop, flags&linux.AT_RECURSIVE != 0)
+		if err != nil {
+			return 0, nil, err
+		}
+		file, err = t.Kernel().VFS().NewDetachedMountFD(mnt, 0)
+		mnt.DecRef(t)
+		if err != nil {
+			return 0, nil, err
+		}
+	} else {
+		file, err = t.Kernel().VFS().OpenAt(t, creds, &tpop.pop, &vfs.OpenOptions{
+			Flags: linux.O_PATH,
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	defer file.DecRef(t)
+
+	fd, err := t.NewFDFromVFS2(0, file, kernel.FDFlags{
+		CloseOnExec: flags&linux.OPEN_TREE_CLOEXEC != 0,
+	})
+	return uintptr(fd), nil, err
+}
+
+// MoveMount implements Linux syscall move_mount(2).
+func MoveMount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fromDirfd := args[0].Int()
+	fromPathAddr := args[1].Pointer()
+	toDirfd := args[2].Int()
+	toPathAddr := args[3].Pointer()
+	flags := args[4].Uint()
+
+	const validFlags = linux.MOVE_MOUNT_F_SYMLINKS | linux.MOVE_MOUNT_F_AUTOMOUNTS | linux.MOVE_MOUNT_F_EMPTY_PATH |
+		linux.MOVE_MOUNT_T_SYMLINKS | linux.MOVE_MOUNT_T_AUTOMOUNTS | linux.MOVE_MOUNT_T_EMPTY_PATH
+	// MOVE_MOUNT_SET_GROUP and MOVE_MOUNT_BENEATH are unimplemented.
+	if flags&^validFlags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	creds := t.Credentials()
+	if !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespaceVFS2().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	fromPath, err := copyInPath(t, fromPathAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	from, err := getTaskPathOperation(t, fromDirfd, fromPath, shouldAllowEmptyPath(flags&linux.MOVE_MOUNT_F_EMPTY_PATH != 0), shouldFollowFinalSymlink(flags&linux.MOVE_MOUNT_F_SYMLINKS != 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer from.Release(t)
+
+	toPath, err := copyInPath(t, toPathAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	to, err := getTaskPathOperation(t, toDirfd, toPath, shouldAllowEmptyPath(flags&linux.MOVE_MOUNT_T_EMPTY_PATH != 0), shouldFollowFinalSymlink(flags&linux.MOVE_MOUNT_T_SYMLINKS != 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer to.Release(t)
+
+	return 0, nil, t.Kernel().VFS().MoveMountAt(t, creds, &from.pop, &to.pop)
+}
+
+// mountAttrFlags is the set of MOUNT_ATTR_* attributes that can be passed to
+// fsmount(2) and mount_setattr(2).
+const mountAttrFlags = linux.MOUNT_ATTR_RDONLY | linux.MOUNT_ATTR_NOSUID | linux.MOUNT_ATTR_NODEV | linux.MOUNT_ATTR_NOEXEC | linux.MOUNT_ATTR__ATIME
+
+// MountSetattr implements Linux syscall mount_setattr(2).
+func MountSetattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	dirfd := args[0].Int()
+	pathAddr := args[1].Pointer()
+	flags := args[2].Uint()
+	attrAddr := args[3].Pointer()
+	size := args[4].SizeT()
+
+	const validFlags = linux.AT_EMPTY_PATH | linux.AT_NO_AUTOMOUNT | linux.AT_RECURSIVE | linux.AT_SYMLINK_NOFOLLOW
+	if flags&^validFlags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if size < linux.MOUNT_ATTR_SIZE_VER0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if size > hostarch.PageSize {
+		return 0, nil, linuxerr.E2BIG
+	}
+	var attr linux.MountAttr
+	if _, err := attr.CopyIn(t, attrAddr); err != nil {
+		return 0, nil, err
+	}
+	// Compare Linux's copy_struct_from_user(): bytes past the end of the
+	// struct we know about must be zero.
+	if extra := int(size) - attr.SizeBytes(); extra > 0 {
+		buf := make([]byte, extra)
+		if _, err := t.CopyInBytes(attrAddr+hostarch.Addr(attr.SizeBytes()), buf); err != nil {
+			return 0, nil, err
+		}
+		for _, b := range buf {
+			if b != 0 {
+				return 0, nil, linuxerr.E2BIG
+			}
+		}
+	}
+	if attr.AttrSet == 0 && attr.AttrClr == 0 && attr.Propagation == 0 {
+		return 0, nil, nil
+	}
+
+	// Compare Linux's fs/namespace.c:build_mount_kattr(). No filesystem
+	// supports idmapped mounts.
+	if (attr.AttrSet|attr.AttrClr)&^mountAttrFlags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if err := checkMountAttrATime(attr.AttrSet, attr.AttrClr); err != nil {
+		return 0, nil, err
+	}
+	if attr.UsernsFD != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	propType := vfs.Unknown
+	switch attr.Propagation {
+	case 0:
+	case linux.MS_SHARED, linux.MS_PRIVATE:
+		propType = vfs.PropagationTypeFromLinux(attr.Propagation)
+	default:
+		// MS_SLAVE and MS_UNBINDABLE are unimplemented, as for mount(2).
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	creds := t.Credentials()
+	if !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespaceVFS2().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+
+	path, err := copyInPath(t, pathAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	tpop, err := getTaskPathOperation(t, dirfd, path, shouldAllowEmptyPath(flags&linux.AT_EMPTY_PATH != 0), shouldFollowFinalSymlink(flags&linux.AT_SYMLINK_NOFOLLOW == 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tpop.Release(t)
+
+	return 0, nil, t.Kernel().VFS().SetMountAttrAt(t, creds, &tpop.pop, &vfs.SetMountAttrOptions{
+		Set:         attr.AttrSet,
+		Clear:       attr.AttrClr,
+		Propagation: propType,
+		Recursive:   flags&linux.AT_RECURSIVE != 0,
+	})
+}
+
+// checkMountAttrATime checks that the access time mode in set is valid if it
+// is being changed. See Linux's fs/namespace.c:build_mount_kattr().
+func checkMountAttrATime(set, clr uint64) error {
+	if clr&linux.MOUNT_ATTR__ATIME == 0 {
+		if set&linux.MOUNT_ATTR__ATIME != 0 {
+			return linuxerr.EINVAL
+		}
+		return nil
+	}
+	if clr&linux.MOUNT_ATTR__ATIME != linux.MOUNT_ATTR__ATIME {
+		return linuxerr.EINVAL
+	}
+	switch set & linux.MOUNT_ATTR__ATIME {
+	case linux.MOUNT_ATTR_RELATIME, linux.MOUNT_ATTR_NOATIME, linux.MOUNT_ATTR_STRICTATIME:
+		return nil
+	default:
+		return linuxerr.EINVAL
+	}
+}
+
+// fsopenTypes is the set of filesystem types that can be configured with
+// fsopen(2).
+var fsopenTypes = map[string]struct{}{
+	"proc":  {},
+	"sysfs": {},
+	"tmpfs": {},
+}
+
+// Fsopen implements Linux syscall fsopen(2).
+func Fsopen(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fsTypeAddr := args[0].Pointer()
+	flags := args[1].Uint()
+
+	if flags&^linux.FSOPEN_CLOEXEC != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if !t.Credentials().HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespaceVFS2().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+	fsType, err := t.CopyInString(fsTypeAddr, hostarch.PageSize)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, ok := fsopenTypes[fsType]; !ok {
+		return 0, nil, linuxerr.ENODEV
+	}
+
+	file, err := vfs.NewFilesystemContextFD(t, t.Kernel().VFS(), fsType)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	fd, err := t.NewFDFromVFS2(0, file, kernel.FDFlags{
+		CloseOnExec: flags&linux.FSOPEN_CLOEXEC != 0,
+	})
+	return uintptr(fd), nil, err
+}
+
+// fdToFilesystemContext resolves an fd to a filesystem context. If
+// successful, the file will have an extra ref and the caller is responsible
+// for releasing the ref.
+func fdToFilesystemContext(t *kernel.Task, fd int32) (*vfs.FilesystemContext, *vfs.FileDescription, error) {
+	f := t.GetFileVFS2(fd)
+	if f == nil {
+		return nil, nil, linuxerr.EBADF
+	}
+	fsc, ok := f.Impl().(*vfs.FilesystemContext)
+	if !ok {
+		f.DecRef(t)
+		return nil, nil, linuxerr.EINVAL
+	}
+	return fsc, f, nil
+}
+
+// fsconfigMaxString is the maximum length of the key and value arguments of
+// fsconfig(2), including the terminating null byte.
+const fsconfigMaxString = 256
+
+// Fsconfig implements Linux syscall fsconfig(2).
+func Fsconfig(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	cmd := args[1].Uint()
+	keyAddr := args[2].Pointer()
+	valueAddr := args[3].Pointer()
+	aux := args[4].Int()
+
+	// Compare Linux's fs/fsopen.c:fsconfig().
+	switch cmd {
+	case linux.FSCONFIG_SET_FLAG:
+		if keyAddr == 0 || valueAddr != 0 || aux != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	case linux.FSCONFIG_SET_STRING:
+		if keyAddr == 0 || valueAddr == 0 || aux != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	case linux.FSCONFIG_CMD_CREATE:
+		if keyAddr != 0 || valueAddr != 0 || aux != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	case linux.FSCONFIG_SET_BINARY, linux.FSCONFIG_SET_PATH, linux.FSCONFIG_SET_PATH_EMPTY, linux.FSCONFIG_SET_FD:
+		// None of the filesystems supported by fsopen(2) have options of
+		// these kinds.
+		return 0, nil, linuxerr.EINVAL
+	case linux.FSCONFIG_CMD_RECONFIGURE:
+		// Filesystem contexts for reconfiguration are created by fspick(2),
+		// which is unimplemented.
+		return 0, nil, linuxerr.EOPNOTSUPP
+	default:
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+
+	fsc, file, err := fdToFilesystemContext(t, fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	switch cmd {
+	case linux.FSCONFIG_SET_FLAG, linux.FSCONFIG_SET_STRING:
+		key, err := t.CopyInString(keyAddr, fsconfigMaxString)
+		if err != nil {
+			return 0, nil, err
+		}
+		if cmd == linux.FSCONFIG_SET_FLAG {
+			return 0, nil, fsc.SetFlag(key)
+		}
+		value, err := t.CopyInString(valueAddr, fsconfigMaxString)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, fsc.SetString(key, value)
+	default: // linux.FSCONFIG_CMD_CREATE
+		if !t.Credentials().HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespaceVFS2().Owner) {
+			return 0, nil, linuxerr.EPERM
+		}
+		return 0, nil, fsc.Create(t, t.Credentials())
+	}
+}
+
+// Fsmount implements Linux syscall fsmount(2).
+func Fsmount(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fsfd := args[0].Int()
+	flags := args[1].Uint()
+	attrFlags := args[2].Uint64()
+
+	if flags&^linux.FSMOUNT_CLOEXEC != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if attrFlags&^mountAttrFlags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	var opts vfs.MountOptions
+	opts.ReadOnly = attrFlags&linux.MOUNT_ATTR_RDONLY != 0
+	opts.Flags.NoSUID = attrFlags&linux.MOUNT_ATTR_NOSUID != 0
+	opts.Flags.NoDev = attrFlags&linux.MOUNT_ATTR_NODEV != 0
+	opts.Flags.NoExec = attrFlags&linux.MOUNT_ATTR_NOEXEC != 0
+	switch attrFlags & linux.MOUNT_ATTR__ATIME {
+	case linux.MOUNT_ATTR_RELATIME, linux.MOUNT_ATTR_STRICTATIME:
+	case linux.MOUNT_ATTR_NOATIME:
+		opts.Flags.NoATime = true
+	default:
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	creds := t.Credentials()
+	if !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.MountNamespaceVFS2().Owner) {
+		return 0, nil, linuxerr.EPERM
+	}
+	fsc, file, err := fdToFilesystemContext(t, fsfd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	mnt, err := fsc.Mount(creds, &opts)
+	if err != nil {
+		return 0, nil, err
+	}
+	mntFile, err := t.Kernel().VFS().NewDetachedMountFD(mnt, 0)
+	mnt.DecRef(t)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer mntFile.DecRef(t)
+
+	fd, err := t.NewFDFromVFS2(0, mntFile, kernel.FDFlags{
+		CloseOnExec: flags&linux.FSMOUNT_CLOEXEC != 0,
+	})
+	return uintptr(fd), nil, err
+}
@@ -16,9 +16,16 @@ package vfs2
 
 import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/mqfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/mq"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
 
 // MqOpen implements mq_open(2).
@@ -77,6 +84,267 @@ func MqUnlink(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 	return 0, nil, t.IPCNamespace().PosixQueues().Remove(t, name)
 }
 
+// MqTimedsend implements mq_timedsend(2).
+func MqTimedsend(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	mqdes := args[0].Int()
+	msgAddr := args[1].Pointer()
+	msgLen := args[2].SizeT()
+	msgPrio := args[3].Uint()
+	timeoutAddr := args[4].Pointer()
+
+	if msgPrio > mq.MaxPriority {
+		return 0, nil, linuxerr.EINVAL
+	}
+	ts, haveTimeout, err := copyInMqTimeout(t, timeoutAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	view, f, err := fdToMqView(t, mqdes)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.DecRef(t)
+
+	if !f.IsWritable() {
+		return 0, nil, linuxerr.EBADF
+	}
+	// Check the size before copying in the message, to avoid allocating a
+	// buffer of an arbitrary size.
+	if msgLen > uint(view.Attr().MqMsgsize) {
+		return 0, nil, linuxerr.EMSGSIZE
+	}
+	text := make([]byte, msgLen)
+	if _, err := t.CopyInBytes(msgAddr, text); err != nil {
+		return 0, nil, err
+	}
+	msg := mq.Message{
+		Text:     string(text),
+		Size:     uint64(msgLen),
+		Priority: msgPrio,
+	}
+
+	block := f.StatusFlags()&linux.O_NONBLOCK == 0
+	err = withMqTimer(t, ts, haveTimeout, func(tchan <-chan struct{}) error {
+		return view.Send(t, t, msg, block, tchan)
+	})
+	return 0, nil, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+}
+
+// MqTimedreceive implements mq_timedreceive(2).
+func MqTimedreceive(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	mqdes := args[0].Int()
+	msgAddr := args[1].Pointer()
+	msgLen := args[2].SizeT()
+	msgPrioAddr := args[3].Pointer()
+	timeoutAddr := args[4].Pointer()
+
+	ts, haveTimeout, err := copyInMqTimeout(t, timeoutAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	view, f, err := fdToMqView(t, mqdes)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.DecRef(t)
+
+	if !f.IsReadable() {
+		return 0, nil, linuxerr.EBADF
+	}
+
+	var msg *mq.Message
+	block := f.StatusFlags()&linux.O_NONBLOCK == 0
+	err = withMqTimer(t, ts, haveTimeout, func(tchan <-chan struct{}) error {
+		var err error
+		msg, err = view.Receive(t, t, uint64(msgLen), block, tchan)
+		return err
+	})
+	if err != nil {
+		return 0, nil, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+	}
+
+	// As in Linux, the message is lost if copying it out fails.
+	if msgPrioAddr != 0 {
+		prio := primitive.Uint32(msg.Priority)
+		if _, err := prio.CopyOut(t, msgPrioAddr); err != nil {
+			return 0, nil, err
+		}
+	}
+	if _, err := t.CopyOutBytes(msgAddr, []byte(msg.Text)); err != nil {
+		return 0, nil, err
+	}
+	return uintptr(msg.Size), nil, nil
+}
+
+// MqNotify implements mq_notify(2).
+func MqNotify(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	mqdes := args[0].Int()
+	sevpAddr := args[1].Pointer()
+
+	var (
+		sev      linux.Sigevent
+		notifier mq.Notifier
+	)
+	if sevpAddr != 0 {
+		if _, err := sev.CopyIn(t, sevpAddr); err != nil {
+			return 0, nil, err
+		}
+		switch sev.Notify {
+		case linux.SIGEV_NONE:
+		case linux.SIGEV_SIGNAL:
+			if !linux.Signal(sev.Signo).IsValid() {
+				return 0, nil, linuxerr.EINVAL
+			}
+			notifier = &mqSignalNotifier{
+				tg:    t.ThreadGroup(),
+				signo: sev.Signo,
+				value: sev.Value,
+			}
+		case linux.SIGEV_THREAD:
+			// glibc implements SIGEV_THREAD by passing a netlink socket
+			// to the kernel, which will receive the notification.
+			return 0, nil, linuxerr.ENOTSUP
+		default:
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+
+	view, f, err := fdToMqView(t, mqdes)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.DecRef(t)
+
+	if sevpAddr == 0 {
+		return 0, nil, view.Subscribe(t, nil)
+	}
+	return 0, nil, view.Subscribe(t, mq.NewSubscriber(t, sev.Notify, sev.Signo, notifier))
+}
+
+// MqGetsetattr implements mq_getsetattr(2).
+func MqGetsetattr(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	mqdes := args[0].Int()
+	newAttrAddr := args[1].Pointer()
+	oldAttrAddr := args[2].Pointer()
+
+	var newAttr linux.MqAttr
+	if newAttrAddr != 0 {
+		if _, err := newAttr.CopyIn(t, newAttrAddr); err != nil {
+			return 0, nil, err
+		}
+		// Only O_NONBLOCK can be changed; the other attributes are ignored.
+		if newAttr.MqFlags&^linux.O_NONBLOCK != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+
+	view, f, err := fdToMqView(t, mqdes)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.DecRef(t)
+
+	oldAttr := view.Attr()
+	oldAttr.MqFlags = int64(f.StatusFlags() & linux.O_NONBLOCK)
+	if newAttrAddr != 0 {
+		flags := f.StatusFlags()&^linux.O_NONBLOCK | uint32(newAttr.MqFlags)
+		if err := f.SetStatusFlags(t, t.Credentials(), flags); err != nil {
+			return 0, nil, err
+		}
+	}
+	if oldAttrAddr != 0 {
+		if _, err := oldAttr.CopyOut(t, oldAttrAddr); err != nil {
+			return 0, nil, err
+		}
+	}
+	return 0, nil, nil
+}
+
+// fdToMqView resolves fd to a view into a message queue. If successful, the
+// file will have an extra ref and the caller is responsible for releasing the
+// ref.
+func fdToMqView(t *kernel.Task, fd int32) (mq.View, *vfs.FileDescription, error) {
+	f := t.GetFileVFS2(fd)
+	if f == nil {
+		return nil, nil, linuxerr.EBADF
+	}
+	view, ok := mqfs.View(f)
+	if !ok {
+		// Not a message queue.
+		f.DecRef(t)
+		return nil, nil, linuxerr.EBADF
+	}
+	return view, f, nil
+}
+
+// copyInMqTimeout copies in the absolute CLOCK_REALTIME timeout of
+// mq_timedsend(2) and mq_timedreceive(2). It returns false if timeoutAddr is
+// NULL, i.e. there is no timeout.
+func copyInMqTimeout(t *kernel.Task, timeoutAddr hostarch.Addr) (linux.Timespec, bool, error) {
+	var ts linux.Timespec
+	if timeoutAddr == 0 {
+		return ts, false, nil
+	}
+	if _, err := ts.CopyIn(t, timeoutAddr); err != nil {
+		return ts, false, err
+	}
+	if !ts.Valid() {
+		return ts, false, linuxerr.EINVAL
+	}
+	return ts, true, nil
+}
+
+// withMqTimer calls f with a channel that is notified when the absolute
+// CLOCK_REALTIME deadline ts expires, or with a nil channel if haveTimeout is
+// false.
+func withMqTimer(t *kernel.Task, ts linux.Timespec, haveTimeout bool, f func(tchan <-chan struct{}) error) error {
+	if !haveTimeout {
+		return f(nil)
+	}
+	notifier, tchan := ktime.NewChannelNotifier()
+	timer := ktime.NewTimer(t.Kernel().RealtimeClock(), notifier)
+	defer timer.Destroy()
+	timer.Swap(ktime.Setting{
+		Enabled: true,
+		Next:    ktime.FromTimespec(ts),
+	})
+	return f(tchan)
+}
+
+// mqSignalNotifier implements mq.Notifier for SIGEV_SIGNAL notifications.
+//
+// +stateify savable
+type mqSignalNotifier struct {
+	// tg is the registered process.
+	tg *kernel.ThreadGroup
+
+	// signo is the signal sent to tg.
+	signo int32
+
+	// value is the sigev_value passed to mq_notify.
+	value uint64
+}
+
+// Notify implements mq.Notifier.Notify.
+func (n *mqSignalNotifier) Notify(ctx context.Context) {
+	info := &linux.SignalInfo{
+		Signo: n.signo,
+		Code:  linux.SI_MESGQ,
+	}
+	info.SetSigval(n.value)
+	if sender := kernel.TaskFromContext(ctx); sender != nil {
+		info.SetPID(int32(n.tg.PIDNamespace().IDOfThreadGroup(sender.ThreadGroup())))
+		if leader := n.tg.Leader(); leader != nil {
+			info.SetUID(int32(sender.Credentials().RealKUID.In(leader.UserNamespace()).OrOverflow()))
+		}
+	}
+	// The registered process may have exited, in which case the
+	// notification is dropped.
+	_ = n.tg.SendSignal(info)
+}
+
 func openOpts(name string, rOnly, wOnly, readWrite, create, exclusive, block bool) mq.OpenOpts {
 	var access mq.AccessType
 	switch {
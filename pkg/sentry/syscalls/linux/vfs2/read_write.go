@@ -108,6 +108,7 @@ func read(t *kernel.Task, file *vfs.FileDescription, dst usermem.IOSequence, opt
 	}
 
 	total := n
+	busyPolled := false
 	for {
 		// Shorten dst to reflect bytes previously read.
 		dst = dst.DropFirst(int(n))
@@ -120,6 +121,14 @@ func read(t *kernel.Task, file *vfs.FileDescription, dst usermem.IOSequence, opt
 			break
 		}
 
+		// Busy poll before the first sleep, if the file does.
+		if !busyPolled {
+			busyPolled = true
+			if bp, ok := file.Impl().(kernel.BusyPoller); ok && t.BusyPoll(bp.BusyPollUsec(), func() bool { return file.Readiness(eventMaskRead) != 0 }) {
+				continue
+			}
+		}
+
 		// Wait for a notification that we should retry.
 		if err = t.BlockWithDeadline(ch, hasDeadline, deadline); err != nil {
 			if linuxerr.Equals(linuxerr.ETIMEDOUT, err) {
@@ -238,9 +247,17 @@ func Preadv2(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysca
 		Flags: uint32(flags),
 	}
 	var n int64
-	if offset == -1 {
+	switch {
+	case flags&linux.RWF_NOWAIT != 0:
+		// Fail with EAGAIN rather than blocking.
+		if offset == -1 {
+			n, err = file.Read(t, dst, opts)
+		} else {
+			n, err = file.PRead(t, dst, offset, opts)
+		}
+	case offset == -1:
 		n, err = read(t, file, dst, opts)
-	} else {
+	default:
 		n, err = pread(t, file, dst, offset, opts)
 	}
 	t.IOUsage().AccountReadSyscall(n)
@@ -228,19 +228,19 @@ func Fallocate(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	if !file.IsWritable() {
 		return 0, nil, linuxerr.EBADF
 	}
-	if mode != 0 {
-		return 0, nil, linuxerr.ENOTSUP
-	}
 	if offset < 0 || length <= 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
+	if err := checkFallocateMode(mode); err != nil {
+		return 0, nil, err
+	}
 
 	size := offset + length
 	if size < 0 {
 		return 0, nil, linuxerr.EFBIG
 	}
 	limit := limits.FromContext(t).Get(limits.FileSize).Cur
-	if uint64(size) >= limit {
+	if mode&(linux.FALLOC_FL_KEEP_SIZE|linux.FALLOC_FL_COLLAPSE_RANGE) == 0 && uint64(size) >= limit {
 		t.SendSignal(&linux.SignalInfo{
 			Signo: int32(linux.SIGXFSZ),
 			Code:  linux.SI_USER,
@@ -251,6 +251,33 @@ func Fallocate(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sys
 	return 0, nil, file.Allocate(t, mode, uint64(offset), uint64(length))
 }
 
+// checkFallocateMode returns an error if mode is not a valid combination of
+// fallocate(2) flags. Filesystems reject valid modes that they don't support.
+// Compare Linux's fs/open.c:vfs_fallocate().
+func checkFallocateMode(mode uint64) error {
+	const supportedMask = linux.FALLOC_FL_KEEP_SIZE | linux.FALLOC_FL_PUNCH_HOLE | linux.FALLOC_FL_COLLAPSE_RANGE | linux.FALLOC_FL_ZERO_RANGE | linux.FALLOC_FL_INSERT_RANGE | linux.FALLOC_FL_UNSHARE_RANGE
+	switch {
+	case mode&^supportedMask != 0:
+		return linuxerr.EOPNOTSUPP
+	case mode&(linux.FALLOC_FL_PUNCH_HOLE|linux.FALLOC_FL_ZERO_RANGE) == linux.FALLOC_FL_PUNCH_HOLE|linux.FALLOC_FL_ZERO_RANGE:
+		// "Punch hole and zero range are mutually exclusive."
+		return linuxerr.EOPNOTSUPP
+	case mode&linux.FALLOC_FL_PUNCH_HOLE != 0 && mode&linux.FALLOC_FL_KEEP_SIZE == 0:
+		// "Punch hole must have keep size set."
+		return linuxerr.EOPNOTSUPP
+	case mode&linux.FALLOC_FL_COLLAPSE_RANGE != 0 && mode&^linux.FALLOC_FL_COLLAPSE_RANGE != 0:
+		// "Collapse range should only be used exclusively."
+		return linuxerr.EINVAL
+	case mode&linux.FALLOC_FL_INSERT_RANGE != 0 && mode&^linux.FALLOC_FL_INSERT_RANGE != 0:
+		// "Insert range should only be used exclusively."
+		return linuxerr.EINVAL
+	case mode&linux.FALLOC_FL_UNSHARE_RANGE != 0 && mode&^(linux.FALLOC_FL_UNSHARE_RANGE|linux.FALLOC_FL_KEEP_SIZE) != 0:
+		// "Unshare range should only be used with allocate mode."
+		return linuxerr.EINVAL
+	}
+	return nil
+}
+
 // Utime implements Linux syscall utime(2).
 func Utime(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	pathAddr := args[0].Pointer()
@@ -18,7 +18,9 @@ import (
 	"io"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
@@ -378,6 +380,8 @@ func Sendfile(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 				break
 			}
 		}
+	} else if outRF, ok := outFile.Impl().(readerFrom); ok && !inFile.Options().DenyPRead {
+		total, offset, err = sendfileToReaderFrom(t, &dw, inFile, outRF, offset, count, nonBlock)
 	} else {
 		// Read inFile to buffer, then write the contents to outFile.
 		//
@@ -472,6 +476,103 @@ func Sendfile(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 	return uintptr(total), nil, slinux.HandleIOErrorVFS2(t, total != 0, err, linuxerr.ERESTARTSYS, "sendfile", inFile)
 }
 
+// readerFrom is implemented by file descriptions that can write data read
+// directly from an io.Reader, avoiding the intermediate buffer used by
+// sendfile(2) otherwise. For example, netstack sockets read into their send
+// buffers.
+type readerFrom interface {
+	// ReadFrom writes up to count bytes read from r, and returns the number
+	// of bytes written. It returns linuxerr.ErrWouldBlock if fewer than count
+	// bytes were written for any reason, including r reaching EOF.
+	//
+	// r may be read past the returned count; the excess data is discarded.
+	ReadFrom(ctx context.Context, r io.Reader, count int64) (int64, error)
+}
+
+// sendfileToReaderFrom implements the data transfer of sendfile(2) when the
+// output file implements readerFrom. inFile is read with PRead at offset, or
+// at its file offset if offset is -1, so that data read past the count
+// consumed by outFile is simply read again by the next iteration. It returns
+// the number of bytes transferred and the updated offset.
+func sendfileToReaderFrom(t *kernel.Task, dw *dualWaiter, inFile *vfs.FileDescription, outFile readerFrom, offset, count int64, nonBlock bool) (int64, int64, error) {
+	useFileOffset := offset == -1
+	if useFileOffset {
+		off, err := inFile.Seek(t, 0, linux.SEEK_CUR)
+		if err != nil {
+			return 0, offset, err
+		}
+		offset = off
+	}
+
+	var (
+		total int64
+		err   error
+	)
+	for {
+		r := fileReader{
+			t:   t,
+			fd:  inFile,
+			off: offset,
+		}
+		var n int64
+		n, err = outFile.ReadFrom(t, &r, count-total)
+		offset += n
+		total += n
+		if total == count {
+			break
+		}
+		if err == linuxerr.ErrWouldBlock && r.eof && r.off == offset {
+			// inFile was exhausted, rather than outFile being full.
+			err = io.EOF
+			break
+		}
+		if err == nil && t.Interrupted() {
+			err = linuxerr.ErrInterrupted
+			break
+		}
+		if err == linuxerr.ErrWouldBlock && !nonBlock {
+			err = dw.waitForOut(t)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if useFileOffset {
+		if _, seekErr := inFile.Seek(t, offset, linux.SEEK_SET); seekErr != nil {
+			// Log the error but don't return it, since the data has already
+			// been written.
+			log.Warningf("failed to update input file offset: %v", seekErr)
+		}
+		offset = -1
+	}
+	return total, offset, err
+}
+
+// fileReader implements io.Reader for a vfs.FileDescription by reading at an
+// explicit offset, without changing the file offset.
+type fileReader struct {
+	t   *kernel.Task
+	fd  *vfs.FileDescription
+	off int64
+
+	// eof is set once fd has returned io.EOF.
+	eof bool
+}
+
+// Read implements io.Reader.Read.
+func (r *fileReader) Read(dst []byte) (int, error) {
+	if len(dst) == 0 {
+		return 0, nil
+	}
+	n, err := r.fd.PRead(r.t, usermem.BytesIOSequence(dst), r.off, vfs.ReadOptions{})
+	r.off += n
+	if err == io.EOF {
+		r.eof = true
+	}
+	return int(n), err
+}
+
 // dualWaiter is used to wait on one or both vfs.FileDescriptions. It is not
 // thread-safe, and does not take a reference on the vfs.FileDescriptions.
 //
@@ -535,3 +636,193 @@ func (dw *dualWaiter) destroy() {
 	dw.inFile = nil
 	dw.outFile = nil
 }
+
+// CopyFileRange implements Linux syscall copy_file_range(2).
+func CopyFileRange(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	inFD := args[0].Int()
+	inOffsetAddr := args[1].Pointer()
+	outFD := args[2].Int()
+	outOffsetAddr := args[3].Pointer()
+	count := int64(args[4].SizeT())
+	flags := args[5].Uint()
+
+	inFile := t.GetFileVFS2(inFD)
+	if inFile == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer inFile.DecRef(t)
+	outFile := t.GetFileVFS2(outFD)
+	if outFile == nil {
+		return 0, nil, linuxerr.EBADF
+	}
+	defer outFile.DecRef(t)
+
+	// Copy in offsets.
+	inOffset, err := copyFileRangeOffset(t, inFile, inOffsetAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	outOffset, err := copyFileRangeOffset(t, outFile, outOffsetAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// The following checks are from Linux's
+	// fs/read_write.c:vfs_copy_file_range() =>
+	// generic_copy_file_checks().
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	const statMask = linux.STATX_TYPE | linux.STATX_INO | linux.STATX_SIZE
+	inStat, err := inFile.Stat(t, vfs.StatOptions{Mask: statMask})
+	if err != nil {
+		return 0, nil, err
+	}
+	outStat, err := outFile.Stat(t, vfs.StatOptions{Mask: statMask})
+	if err != nil {
+		return 0, nil, err
+	}
+	if inStat.Mode&linux.S_IFMT == linux.S_IFDIR || outStat.Mode&linux.S_IFMT == linux.S_IFDIR {
+		return 0, nil, linuxerr.EISDIR
+	}
+	if inStat.Mode&linux.S_IFMT != linux.S_IFREG || outStat.Mode&linux.S_IFMT != linux.S_IFREG {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if !inFile.IsReadable() || !outFile.IsWritable() || outFile.StatusFlags()&linux.O_APPEND != 0 {
+		return 0, nil, linuxerr.EBADF
+	}
+	if inOffset < 0 || outOffset < 0 || count < 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if inOffset+count < inOffset || outOffset+count < outOffset {
+		return 0, nil, linuxerr.EOVERFLOW
+	}
+	// Shorten the copy to the end of the input file.
+	if size := int64(inStat.Size); inOffset >= size {
+		count = 0
+	} else if count > size-inOffset {
+		count = size - inOffset
+	}
+	// Overlapping copies within the same file are not allowed.
+	if inStat.DevMajor == outStat.DevMajor && inStat.DevMinor == outStat.DevMinor && inStat.Ino == outStat.Ino &&
+		inOffset+count > outOffset && outOffset+count > inOffset {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if count > int64(kernel.MAX_RW_COUNT) {
+		count = int64(kernel.MAX_RW_COUNT)
+	}
+	if count == 0 {
+		return 0, nil, nil
+	}
+
+	// Try to have the output file copy the data without passing it through
+	// the sentry, e.g. on the gofer's host. Fall back to copying the data
+	// through a buffer, which also handles copies between filesystems.
+	var total int64
+	if outFRC, ok := outFile.Impl().(fileRangeCopier); ok {
+		total, err = outFRC.CopyFileRangeFrom(t, inFile, inOffset, outOffset, count)
+	} else {
+		err = linuxerr.EXDEV
+	}
+	if linuxerr.Equals(linuxerr.EXDEV, err) {
+		total, err = copyFileRangeBuffered(t, inFile, outFile, inOffset, outOffset, count)
+	}
+
+	// Update offsets.
+	if total != 0 {
+		if err := updateCopyFileRangeOffset(t, inFile, inOffsetAddr, inOffset+total); err != nil {
+			return 0, nil, err
+		}
+		if err := updateCopyFileRangeOffset(t, outFile, outOffsetAddr, outOffset+total); err != nil {
+			return 0, nil, err
+		}
+		if err != nil && err != io.EOF {
+			// If a partial copy is completed, the error is dropped. Log it
+			// here.
+			log.Debugf("copy_file_range completed a partial copy with error: %v", err)
+			err = nil
+		}
+	}
+	return uintptr(total), nil, slinux.HandleIOErrorVFS2(t, total != 0, err, linuxerr.ERESTARTSYS, "copy_file_range", outFile)
+}
+
+// fileRangeCopier is implemented by file descriptions that can copy data
+// from another file description without passing it through the sentry, as
+// by copy_file_range(2).
+type fileRangeCopier interface {
+	// CopyFileRangeFrom copies up to count bytes from src at srcOff to the
+	// file at off, and returns the number of bytes copied. It returns
+	// linuxerr.EXDEV if it can't copy from src.
+	CopyFileRangeFrom(ctx context.Context, src *vfs.FileDescription, srcOff, off, count int64) (int64, error)
+}
+
+// copyFileRangeOffset returns the offset copy_file_range(2) should use for fd:
+// the offset at addr if it is not 0, or the file offset of fd otherwise.
+func copyFileRangeOffset(t *kernel.Task, fd *vfs.FileDescription, addr hostarch.Addr) (int64, error) {
+	if addr == 0 {
+		return fd.Seek(t, 0, linux.SEEK_CUR)
+	}
+	if fd.Options().DenyPRead || fd.Options().DenyPWrite {
+		return 0, linuxerr.ESPIPE
+	}
+	var offsetP primitive.Int64
+	if _, err := offsetP.CopyIn(t, addr); err != nil {
+		return 0, err
+	}
+	return int64(offsetP), nil
+}
+
+// updateCopyFileRangeOffset stores the offset after copy_file_range(2) for
+// fd, at addr if it is not 0, or in the file offset of fd otherwise.
+func updateCopyFileRangeOffset(t *kernel.Task, fd *vfs.FileDescription, addr hostarch.Addr, offset int64) error {
+	if addr == 0 {
+		if _, err := fd.Seek(t, offset, linux.SEEK_SET); err != nil {
+			// Log the error but don't return it, since the data has already
+			// been copied.
+			log.Warningf("failed to update file offset: %v", err)
+		}
+		return nil
+	}
+	offsetP := primitive.Int64(offset)
+	_, err := offsetP.CopyOut(t, addr)
+	return err
+}
+
+// copyFileRangeBuffered copies up to count bytes from inFile at inOffset to
+// outFile at outOffset through a buffer in the sentry, and returns the number
+// of bytes copied.
+func copyFileRangeBuffered(t *kernel.Task, inFile, outFile *vfs.FileDescription, inOffset, outOffset, count int64) (int64, error) {
+	// As in sendfile(2), limit the buffer size to the size of a pipe.
+	bufSize := count
+	if bufSize > pipe.MaximumPipeSize {
+		bufSize = pipe.MaximumPipeSize
+	}
+	buf := make([]byte, bufSize)
+	var total int64
+	for total < count {
+		if int64(len(buf)) > count-total {
+			buf = buf[:count-total]
+		}
+		readN, err := inFile.PRead(t, usermem.BytesIOSequence(buf), inOffset+total, vfs.ReadOptions{})
+		if readN == 0 {
+			return total, err
+		}
+		// Write all of the bytes that we read. Since outFile is a regular
+		// file, a short write means that the write failed.
+		writeN, writeErr := outFile.PWrite(t, usermem.BytesIOSequence(buf[:readN]), outOffset+total, vfs.WriteOptions{})
+		total += writeN
+		if writeErr != nil {
+			return total, writeErr
+		}
+		if writeN < readN {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+		if t.Interrupted() {
+			return total, linuxerr.ErrInterrupted
+		}
+	}
+	return total, nil
+}
@@ -42,13 +42,21 @@ func TimerfdCreate(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel
 
 	var clock ktime.Clock
 	switch clockID {
-	case linux.CLOCK_REALTIME:
+	case linux.CLOCK_REALTIME, linux.CLOCK_REALTIME_ALARM:
 		clock = t.Kernel().RealtimeClock()
-	case linux.CLOCK_MONOTONIC, linux.CLOCK_BOOTTIME:
-		clock = t.Kernel().MonotonicClock()
+	case linux.CLOCK_MONOTONIC:
+		clock = t.TimeNamespace().MonotonicClock()
+	case linux.CLOCK_BOOTTIME, linux.CLOCK_BOOTTIME_ALARM:
+		clock = t.TimeNamespace().BoottimeClock()
 	default:
 		return 0, nil, linuxerr.EINVAL
 	}
+	// Alarm clocks are mapped to the corresponding non-alarm clocks, since the
+	// sandbox can't wake the host from suspend. As in Linux, using them still
+	// requires CAP_WAKE_ALARM.
+	if (clockID == linux.CLOCK_REALTIME_ALARM || clockID == linux.CLOCK_BOOTTIME_ALARM) && !t.HasCapability(linux.CAP_WAKE_ALARM) {
+		return 0, nil, linuxerr.EPERM
+	}
 	vfsObj := t.Kernel().VFS()
 	file, err := timerfd.New(t, vfsObj, clock, fileFlags)
 	if err != nil {
@@ -109,12 +109,16 @@ func Override() {
 	s.Table[209] = syscalls.PartiallySupported("io_submit", IoSubmit, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"})
 	s.Table[213] = syscalls.Supported("epoll_create", EpollCreate)
 	s.Table[217] = syscalls.Supported("getdents64", Getdents64)
-	s.Table[221] = syscalls.PartiallySupported("fadvise64", Fadvise64, "The syscall is 'supported', but ignores all provided advice.", nil)
+	s.Table[221] = syscalls.PartiallySupported("fadvise64", Fadvise64, "Advice is only acted on for files on gofer mounts; it is ignored for other files.", nil)
 	s.Table[232] = syscalls.Supported("epoll_wait", EpollWait)
 	s.Table[233] = syscalls.Supported("epoll_ctl", EpollCtl)
 	s.Table[235] = syscalls.Supported("utimes", Utimes)
 	s.Table[240] = syscalls.Supported("mq_open", MqOpen)
 	s.Table[241] = syscalls.Supported("mq_unlink", MqUnlink)
+	s.Table[242] = syscalls.Supported("mq_timedsend", MqTimedsend)
+	s.Table[243] = syscalls.Supported("mq_timedreceive", MqTimedreceive)
+	s.Table[244] = syscalls.PartiallySupported("mq_notify", MqNotify, "SIGEV_THREAD is not supported.", nil)
+	s.Table[245] = syscalls.Supported("mq_getsetattr", MqGetsetattr)
 	s.Table[253] = syscalls.PartiallySupportedPoint("inotify_init", InotifyInit, linux.PointInotifyInit, "inotify events are only available inside the sandbox.", nil)
 	s.Table[254] = syscalls.PartiallySupportedPoint("inotify_add_watch", InotifyAddWatch, linux.PointInotifyAddWatch, "inotify events are only available inside the sandbox.", nil)
 	s.Table[255] = syscalls.PartiallySupportedPoint("inotify_rm_watch", InotifyRmWatch, linux.PointInotifyRmWatch, "inotify events are only available inside the sandbox.", nil)
@@ -154,20 +158,38 @@ func Override() {
 	s.Table[295] = syscalls.Supported("preadv", Preadv)
 	s.Table[296] = syscalls.Supported("pwritev", Pwritev)
 	s.Table[299] = syscalls.Supported("recvmmsg", RecvMMsg)
+	s.Table[300] = syscalls.PartiallySupported("fanotify_init", FanotifyInit, "Only FAN_CLASS_NOTIF groups are supported.", nil)
+	s.Table[301] = syscalls.PartiallySupported("fanotify_mark", FanotifyMark, "Only FAN_OPEN, FAN_MODIFY, FAN_CLOSE_WRITE and FAN_CLOSE_NOWRITE events on inode and mount marks are supported. fanotify events are only available inside the sandbox.", nil)
+	s.Table[303] = syscalls.PartiallySupported("name_to_handle_at", NameToHandleAt, "Only supported on tmpfs and gofer filesystems.", nil)
+	s.Table[304] = syscalls.PartiallySupported("open_by_handle_at", OpenByHandleAt, "Only supported on tmpfs and gofer filesystems.", nil)
 	s.Table[306] = syscalls.Supported("syncfs", Syncfs)
 	s.Table[307] = syscalls.Supported("sendmmsg", SendMMsg)
 	// FIXME(zkoopmans): Re-enable calls for process_vm_(read/write)v.
 	s.Table[316] = syscalls.Supported("renameat2", Renameat2)
 	s.Table[319] = syscalls.Supported("memfd_create", MemfdCreate)
 	s.Table[322] = syscalls.SupportedPoint("execveat", Execveat, linux.PointExecveat)
+	s.Table[326] = syscalls.Supported("copy_file_range", CopyFileRange)
 	s.Table[327] = syscalls.Supported("preadv2", Preadv2)
 	s.Table[328] = syscalls.Supported("pwritev2", Pwritev2)
 	s.Table[332] = syscalls.Supported("statx", Statx)
 	s.Table[425] = syscalls.PartiallySupported("io_uring_setup", IOUringSetup, "Not all flags and functionality supported.", nil)
 	s.Table[426] = syscalls.PartiallySupported("io_uring_enter", IOUringEnter, "Not all flags and functionality supported.", nil)
+	s.Table[427] = syscalls.PartiallySupported("io_uring_register", IOUringRegister, "Only IORING_REGISTER_PROBE is supported.", nil)
+	s.Table[428] = syscalls.Supported("open_tree", OpenTree)
+	s.Table[429] = syscalls.PartiallySupported("move_mount", MoveMount, "MOVE_MOUNT_SET_GROUP and MOVE_MOUNT_BENEATH are not supported.", nil)
+	s.Table[430] = syscalls.PartiallySupported("fsopen", Fsopen, "Only tmpfs, proc and sysfs are supported.", nil)
+	s.Table[431] = syscalls.PartiallySupported("fsconfig", Fsconfig, "Only FSCONFIG_SET_FLAG, FSCONFIG_SET_STRING and FSCONFIG_CMD_CREATE are supported.", nil)
+	s.Table[432] = syscalls.Supported("fsmount", Fsmount)
 	s.Table[436] = syscalls.Supported("close_range", CloseRange)
 	s.Table[439] = syscalls.Supported("faccessat2", Faccessat2)
 	s.Table[441] = syscalls.Supported("epoll_pwait2", EpollPwait2)
+	s.Table[442] = syscalls.PartiallySupported("mount_setattr", MountSetattr, "Idmapped mounts, MOUNT_ATTR_NODIRATIME, MOUNT_ATTR_NOSYMFOLLOW, MS_SLAVE and MS_UNBINDABLE are not supported.", nil)
+	s.Table[444] = syscalls.PartiallySupported("landlock_create_ruleset", LandlockCreateRuleset, "Only Landlock ABI version 1 is supported.", nil)
+	s.Table[445] = syscalls.PartiallySupported("landlock_add_rule", LandlockAddRule, "Rules are matched by pathname, so they don't follow renamed or bind mounted files.", nil)
+	s.Table[446] = syscalls.Supported("landlock_restrict_self", LandlockRestrictSelf)
+	s.Table[447] = syscalls.PartiallySupported("memfd_secret", MemfdSecret, "Only supported if enabled with --memfd-secret.", nil)
+	s.Table[447] = syscalls.PartiallySupported("memfd_secret", MemfdSecret, "Only supported if enabled with --memfd-secret.", nil)
+	s.Table[451] = syscalls.PartiallySupported("cachestat", Cachestat, "Only pages cached in sentry memory are reported. Writeback is synchronous and recently evicted pages aren't tracked.", nil)
 	s.Init()
 
 	// Override ARM64.
@@ -252,6 +274,10 @@ func Override() {
 	s.Table[88] = syscalls.Supported("utimensat", Utimensat)
 	s.Table[180] = syscalls.Supported("mq_open", MqOpen)
 	s.Table[181] = syscalls.Supported("mq_unlink", MqUnlink)
+	s.Table[182] = syscalls.Supported("mq_timedsend", MqTimedsend)
+	s.Table[183] = syscalls.Supported("mq_timedreceive", MqTimedreceive)
+	s.Table[184] = syscalls.PartiallySupported("mq_notify", MqNotify, "SIGEV_THREAD is not supported.", nil)
+	s.Table[185] = syscalls.Supported("mq_getsetattr", MqGetsetattr)
 	s.Table[198] = syscalls.SupportedPoint("socket", Socket, linux.PointSocket)
 	s.Table[199] = syscalls.SupportedPoint("socketpair", SocketPair, linux.PointSocketpair)
 	s.Table[200] = syscalls.SupportedPoint("bind", Bind, linux.PointBind)
@@ -270,21 +296,37 @@ func Override() {
 	s.Table[213] = syscalls.Supported("readahead", Readahead)
 	s.Table[221] = syscalls.SupportedPoint("execve", Execve, linux.PointExecve)
 	s.Table[222] = syscalls.Supported("mmap", Mmap)
-	s.Table[223] = syscalls.PartiallySupported("fadvise64", Fadvise64, "Not all options are supported.", nil)
+	s.Table[223] = syscalls.PartiallySupported("fadvise64", Fadvise64, "Advice is only acted on for files on gofer mounts; it is ignored for other files.", nil)
 	s.Table[242] = syscalls.SupportedPoint("accept4", Accept4, linux.PointAccept4)
 	s.Table[243] = syscalls.Supported("recvmmsg", RecvMMsg)
+	s.Table[262] = syscalls.PartiallySupported("fanotify_init", FanotifyInit, "Only FAN_CLASS_NOTIF groups are supported.", nil)
+	s.Table[263] = syscalls.PartiallySupported("fanotify_mark", FanotifyMark, "Only FAN_OPEN, FAN_MODIFY, FAN_CLOSE_WRITE and FAN_CLOSE_NOWRITE events on inode and mount marks are supported. fanotify events are only available inside the sandbox.", nil)
+	s.Table[264] = syscalls.PartiallySupported("name_to_handle_at", NameToHandleAt, "Only supported on tmpfs and gofer filesystems.", nil)
+	s.Table[265] = syscalls.PartiallySupported("open_by_handle_at", OpenByHandleAt, "Only supported on tmpfs and gofer filesystems.", nil)
 	s.Table[267] = syscalls.Supported("syncfs", Syncfs)
 	s.Table[269] = syscalls.Supported("sendmmsg", SendMMsg)
 	s.Table[276] = syscalls.Supported("renameat2", Renameat2)
 	s.Table[279] = syscalls.Supported("memfd_create", MemfdCreate)
 	s.Table[281] = syscalls.SupportedPoint("execveat", Execveat, linux.PointExecveat)
+	s.Table[285] = syscalls.Supported("copy_file_range", CopyFileRange)
 	s.Table[286] = syscalls.Supported("preadv2", Preadv2)
 	s.Table[287] = syscalls.Supported("pwritev2", Pwritev2)
 	s.Table[291] = syscalls.Supported("statx", Statx)
 	s.Table[425] = syscalls.PartiallySupported("io_uring_setup", IOUringSetup, "Not all flags and functionality supported.", nil)
 	s.Table[426] = syscalls.PartiallySupported("io_uring_enter", IOUringEnter, "Not all flags and functionality supported.", nil)
+	s.Table[427] = syscalls.PartiallySupported("io_uring_register", IOUringRegister, "Only IORING_REGISTER_PROBE is supported.", nil)
+	s.Table[428] = syscalls.Supported("open_tree", OpenTree)
+	s.Table[429] = syscalls.PartiallySupported("move_mount", MoveMount, "MOVE_MOUNT_SET_GROUP and MOVE_MOUNT_BENEATH are not supported.", nil)
+	s.Table[430] = syscalls.PartiallySupported("fsopen", Fsopen, "Only tmpfs, proc and sysfs are supported.", nil)
+	s.Table[431] = syscalls.PartiallySupported("fsconfig", Fsconfig, "Only FSCONFIG_SET_FLAG, FSCONFIG_SET_STRING and FSCONFIG_CMD_CREATE are supported.", nil)
+	s.Table[432] = syscalls.Supported("fsmount", Fsmount)
 	s.Table[436] = syscalls.Supported("close_range", CloseRange)
 	s.Table[439] = syscalls.Supported("faccessat2", Faccessat2)
 	s.Table[441] = syscalls.Supported("epoll_pwait2", EpollPwait2)
+	s.Table[442] = syscalls.PartiallySupported("mount_setattr", MountSetattr, "Idmapped mounts, MOUNT_ATTR_NODIRATIME, MOUNT_ATTR_NOSYMFOLLOW, MS_SLAVE and MS_UNBINDABLE are not supported.", nil)
+	s.Table[444] = syscalls.PartiallySupported("landlock_create_ruleset", LandlockCreateRuleset, "Only Landlock ABI version 1 is supported.", nil)
+	s.Table[445] = syscalls.PartiallySupported("landlock_add_rule", LandlockAddRule, "Rules are matched by pathname, so they don't follow renamed or bind mounted files.", nil)
+	s.Table[446] = syscalls.Supported("landlock_restrict_self", LandlockRestrictSelf)
+	s.Table[451] = syscalls.PartiallySupported("cachestat", Cachestat, "Only pages cached in sentry memory are reported. Writeback is synchronous and recently evicted pages aren't tracked.", nil)
 	s.Init()
 }
@@ -0,0 +1,90 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+)
+
+// VirtualClocks is a Clocks whose time doesn't follow the host's: both clocks
+// stand still until they are explicitly advanced with Advance, and always
+// advance together.
+//
+// VirtualClocks never reports its parameters as ready, so that the VDSO falls
+// back to system calls to read the time.
+type VirtualClocks struct {
+	// monotonic is the current monotonic time in nanoseconds.
+	monotonic atomicbitops.Int64
+
+	// realtimeBase is the realtime in nanoseconds when the monotonic time
+	// was zero. It is only changed by Reset.
+	realtimeBase atomicbitops.Int64
+}
+
+// NewVirtualClocks returns a VirtualClocks whose monotonic clock starts at 0
+// and whose realtime clock starts at realtime nanoseconds.
+func NewVirtualClocks(realtime int64) *VirtualClocks {
+	c := &VirtualClocks{}
+	c.realtimeBase.Store(realtime)
+	return c
+}
+
+// Update implements Clocks.Update.
+func (*VirtualClocks) Update() (Parameters, bool, Parameters, bool) {
+	return Parameters{}, false, Parameters{}, false
+}
+
+// GetTime implements Clocks.GetTime.
+func (c *VirtualClocks) GetTime(id ClockID) (int64, error) {
+	switch id {
+	case Monotonic:
+		return c.monotonic.Load(), nil
+	case Realtime:
+		return c.realtimeBase.Load() + c.monotonic.Load(), nil
+	default:
+		return 0, linuxerr.EINVAL
+	}
+}
+
+// Advance advances both clocks by ns nanoseconds, and returns the new
+// monotonic time. Negative values of ns are ignored.
+func (c *VirtualClocks) Advance(ns int64) int64 {
+	if ns <= 0 {
+		return c.monotonic.Load()
+	}
+	return c.monotonic.Add(ns)
+}
+
+// AdvanceTo advances both clocks so that the monotonic time is at least
+// monotonic nanoseconds, and returns the new monotonic time.
+func (c *VirtualClocks) AdvanceTo(monotonic int64) int64 {
+	for {
+		now := c.monotonic.Load()
+		if now >= monotonic {
+			return now
+		}
+		if c.monotonic.CompareAndSwap(now, monotonic) {
+			return monotonic
+		}
+	}
+}
+
+// Reset sets the clocks to the given monotonic and realtime times, in
+// nanoseconds. It is used to resume virtual time from where it was saved.
+func (c *VirtualClocks) Reset(monotonic, realtime int64) {
+	c.monotonic.Store(monotonic)
+	c.realtimeBase.Store(realtime - monotonic)
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"testing"
+)
+
+func TestVirtualClocks(t *testing.T) {
+	c := NewVirtualClocks(1000)
+	check := func(wantMonotonic, wantRealtime int64) {
+		t.Helper()
+		if got, err := c.GetTime(Monotonic); err != nil || got != wantMonotonic {
+			t.Errorf("GetTime(Monotonic) = %d, %v; want %d, nil", got, err, wantMonotonic)
+		}
+		if got, err := c.GetTime(Realtime); err != nil || got != wantRealtime {
+			t.Errorf("GetTime(Realtime) = %d, %v; want %d, nil", got, err, wantRealtime)
+		}
+	}
+	check(0, 1000)
+
+	if _, ok, _, ok2 := c.Update(); ok || ok2 {
+		t.Errorf("Update reported ready parameters")
+	}
+	check(0, 1000)
+
+	if got := c.Advance(5); got != 5 {
+		t.Errorf("Advance(5) = %d, want 5", got)
+	}
+	check(5, 1005)
+
+	if got := c.Advance(-3); got != 5 {
+		t.Errorf("Advance(-3) = %d, want 5", got)
+	}
+	if got := c.AdvanceTo(3); got != 5 {
+		t.Errorf("AdvanceTo(3) = %d, want 5", got)
+	}
+	if got := c.AdvanceTo(20); got != 20 {
+		t.Errorf("AdvanceTo(20) = %d, want 20", got)
+	}
+	check(20, 1020)
+
+	c.Reset(100, 5000)
+	check(100, 5000)
+
+	if _, err := c.GetTime(ClockID(7)); err == nil {
+		t.Errorf("GetTime(7) succeeded, want error")
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// IOSource identifies the file system that performed file I/O.
+type IOSource int
+
+// Sources of file I/O.
+const (
+	// IOSourceGofer is file I/O to files backed by a gofer, i.e. host files.
+	IOSourceGofer IOSource = iota
+
+	// IOSourceTmpfs is file I/O to files backed by sentry memory.
+	IOSourceTmpfs
+
+	// NumIOSources is the number of file I/O sources.
+	NumIOSources
+)
+
+// String implements fmt.Stringer.String.
+func (s IOSource) String() string {
+	switch s {
+	case IOSourceGofer:
+		return "gofer"
+	case IOSourceTmpfs:
+		return "tmpfs"
+	default:
+		return "unknown"
+	}
+}
+
+// IOStat contains file I/O statistics, in the style of cgroup v2 io.stat.
+type IOStat struct {
+	// RBytes is the number of bytes read.
+	RBytes uint64 `json:"rbytes"`
+
+	// WBytes is the number of bytes written.
+	WBytes uint64 `json:"wbytes"`
+
+	// RIOs is the number of read operations.
+	RIOs uint64 `json:"rios"`
+
+	// WIOs is the number of write operations.
+	WIOs uint64 `json:"wios"`
+}
+
+// Add adds other to s.
+func (s *IOStat) Add(other IOStat) {
+	s.RBytes += other.RBytes
+	s.WBytes += other.WBytes
+	s.RIOs += other.RIOs
+	s.WIOs += other.WIOs
+}
+
+// IOLimits contains file I/O limits, in the style of cgroup v2 io.max. A
+// limit of zero means unlimited.
+type IOLimits struct {
+	// RBPS is the maximum number of bytes read per second.
+	RBPS uint64 `json:"rbps"`
+
+	// WBPS is the maximum number of bytes written per second.
+	WBPS uint64 `json:"wbps"`
+
+	// RIOPS is the maximum number of read operations per second.
+	RIOPS uint64 `json:"riops"`
+
+	// WIOPS is the maximum number of write operations per second.
+	WIOPS uint64 `json:"wiops"`
+}
+
+// ioCounters contains the file I/O statistics of a single IOSource.
+//
+// +stateify savable
+type ioCounters struct {
+	rbytes atomicbitops.Uint64
+	wbytes atomicbitops.Uint64
+	rios   atomicbitops.Uint64
+	wios   atomicbitops.Uint64
+}
+
+// ioBucket is a token bucket that may go into debt: a reservation always
+// succeeds, and returns how long the caller must wait for the bucket to pay
+// it back. The bucket holds at most one second worth of tokens.
+type ioBucket struct {
+	rate   uint64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes n tokens from the bucket at time now, and returns how long
+// the caller must wait before its reservation is satisfied.
+func (b *ioBucket) reserve(now time.Time, n uint64) time.Duration {
+	if b.rate == 0 {
+		return 0
+	}
+	rate := float64(b.rate)
+	if b.last.IsZero() {
+		b.tokens = rate
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rate
+		if b.tokens > rate {
+			b.tokens = rate
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// ContainerIO accounts and throttles file I/O performed by the tasks of a
+// single container.
+//
+// +stateify savable
+type ContainerIO struct {
+	// counters is indexed by IOSource.
+	counters [NumIOSources]ioCounters
+
+	// throttledNS is the total time that tasks have been delayed by limits,
+	// in nanoseconds.
+	throttledNS atomicbitops.Uint64
+
+	// mu protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// limits are the limits applied to file I/O.
+	limits IOLimits
+
+	// Token buckets corresponding to limits. These are not saved, and start
+	// out full after restore.
+	rbps  ioBucket `state:"nosave"`
+	wbps  ioBucket `state:"nosave"`
+	riops ioBucket `state:"nosave"`
+	wiops ioBucket `state:"nosave"`
+}
+
+// Stat returns the file I/O statistics of src.
+func (c *ContainerIO) Stat(src IOSource) IOStat {
+	ctr := &c.counters[src]
+	return IOStat{
+		RBytes: ctr.rbytes.Load(),
+		WBytes: ctr.wbytes.Load(),
+		RIOs:   ctr.rios.Load(),
+		WIOs:   ctr.wios.Load(),
+	}
+}
+
+// Throttled returns the total time that tasks have been delayed by limits.
+func (c *ContainerIO) Throttled() time.Duration {
+	return time.Duration(c.throttledNS.Load())
+}
+
+// Limits returns the limits applied to file I/O.
+func (c *ContainerIO) Limits() IOLimits {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limits
+}
+
+// SetLimits changes the limits applied to file I/O. Changes apply to
+// subsequent I/O.
+func (c *ContainerIO) SetLimits(limits IOLimits) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limits = limits
+	c.rbps = ioBucket{rate: limits.RBPS}
+	c.wbps = ioBucket{rate: limits.WBPS}
+	c.riops = ioBucket{rate: limits.RIOPS}
+	c.wiops = ioBucket{rate: limits.WIOPS}
+}
+
+// reserve charges an operation of the given size against the limits at time
+// now, and returns how long the caller must wait before performing it.
+func (c *ContainerIO) reserve(now time.Time, write bool, bytes uint64) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var bps, iops time.Duration
+	if write {
+		bps = c.wbps.reserve(now, bytes)
+		iops = c.wiops.reserve(now, 1)
+	} else {
+		bps = c.rbps.reserve(now, bytes)
+		iops = c.riops.reserve(now, 1)
+	}
+	if iops > bps {
+		return iops
+	}
+	return bps
+}
+
+// account records a completed operation from src.
+func (c *ContainerIO) account(src IOSource, write bool, bytes int64) {
+	ctr := &c.counters[src]
+	if write {
+		ctr.wios.Add(1)
+		if bytes > 0 {
+			ctr.wbytes.Add(uint64(bytes))
+		}
+	} else {
+		ctr.rios.Add(1)
+		if bytes > 0 {
+			ctr.rbytes.Add(uint64(bytes))
+		}
+	}
+}
+
+// contextID is this package's type for context.Context.Value keys.
+type contextID int
+
+const (
+	// CtxContainerIO is a Context.Value key for the *ContainerIO of the
+	// container that the caller belongs to.
+	CtxContainerIO contextID = iota
+)
+
+// containerIOFromContext returns the *ContainerIO used by ctx, or nil if ctx
+// does not belong to a container.
+func containerIOFromContext(ctx context.Context) *ContainerIO {
+	if v := ctx.Value(CtxContainerIO); v != nil {
+		return v.(*ContainerIO)
+	}
+	return nil
+}
+
+// ThrottleIO blocks the caller until an operation of the given size is
+// permitted by the file I/O limits of its container. Throttling never fails
+// the operation: if the caller is interrupted, it proceeds immediately, and
+// the debt is paid back by subsequent operations.
+func ThrottleIO(ctx context.Context, write bool, bytes int64) {
+	c := containerIOFromContext(ctx)
+	if c == nil {
+		return
+	}
+	if bytes < 0 {
+		bytes = 0
+	}
+	d := c.reserve(time.Now(), write, uint64(bytes))
+	if d <= 0 {
+		return
+	}
+	// This only returns once d has elapsed or the caller is interrupted.
+	var q waiter.NeverReady
+	remaining, _ := ctx.BlockWithTimeoutOn(&q, waiter.EventIn, d)
+	c.throttledNS.Add(uint64(d - remaining))
+}
+
+// AccountIO records a completed file I/O operation from src against the
+// container of the caller. bytes is the number of bytes transferred.
+func AccountIO(ctx context.Context, src IOSource, write bool, bytes int64) {
+	if c := containerIOFromContext(ctx); c != nil {
+		c.account(src, write, bytes)
+	}
+}
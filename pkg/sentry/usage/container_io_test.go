@@ -0,0 +1,70 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContainerIOReserve(t *testing.T) {
+	var c ContainerIO
+	c.SetLimits(IOLimits{RBPS: 1000, WIOPS: 10})
+	now := time.Unix(0, 0)
+
+	// The buckets start out with one second's worth of tokens.
+	if d := c.reserve(now, false /* write */, 1000); d != 0 {
+		t.Errorf("first read reserve: got %v, want 0", d)
+	}
+	// The bucket is empty, so 500 more bytes take half a second.
+	if d := c.reserve(now, false /* write */, 500); d != 500*time.Millisecond {
+		t.Errorf("second read reserve: got %v, want 500ms", d)
+	}
+	// After a second, the debt is paid back and half the bucket refilled.
+	if d := c.reserve(now.Add(time.Second), false /* write */, 500); d != 0 {
+		t.Errorf("third read reserve: got %v, want 0", d)
+	}
+
+	// Writes are limited by IOPS but not bytes.
+	for i := 0; i < 10; i++ {
+		if d := c.reserve(now, true /* write */, 1<<30); d != 0 {
+			t.Fatalf("write reserve %d: got %v, want 0", i, d)
+		}
+	}
+	if d := c.reserve(now, true /* write */, 1); d != 100*time.Millisecond {
+		t.Errorf("write reserve over IOPS limit: got %v, want 100ms", d)
+	}
+
+	// Removing the limits removes any debt.
+	c.SetLimits(IOLimits{})
+	if d := c.reserve(now, true /* write */, 1); d != 0 {
+		t.Errorf("write reserve without limits: got %v, want 0", d)
+	}
+}
+
+func TestContainerIOAccount(t *testing.T) {
+	var c ContainerIO
+	c.account(IOSourceGofer, false /* write */, 10)
+	c.account(IOSourceGofer, false /* write */, 0)
+	c.account(IOSourceGofer, true /* write */, 20)
+	c.account(IOSourceTmpfs, true /* write */, -1)
+
+	if got, want := c.Stat(IOSourceGofer), (IOStat{RBytes: 10, WBytes: 20, RIOs: 2, WIOs: 1}); got != want {
+		t.Errorf("gofer stat: got %+v, want %+v", got, want)
+	}
+	if got, want := c.Stat(IOSourceTmpfs), (IOStat{WIOs: 1}); got != want {
+		t.Errorf("tmpfs stat: got %+v, want %+v", got, want)
+	}
+}
@@ -270,28 +270,34 @@ func (m *MemoryLocked) Copy() (MemoryStats, uint64) {
 }
 
 // These options control how much total memory the is reported to the
-// application. They may only be set before the application starts executing,
-// and must not be modified.
+// application. They are set with SetTotalMemory.
 var (
-	// MinimumTotalMemoryBytes is the minimum reported total system memory.
-	MinimumTotalMemoryBytes uint64 = 2 << 30 // 2 GB
+	// minimumTotalMemoryBytes is the minimum reported total system memory.
+	minimumTotalMemoryBytes = atomicbitops.FromUint64(2 << 30) // 2 GB
 
-	// MaximumTotalMemoryBytes is the maximum reported total system memory.
+	// maximumTotalMemoryBytes is the maximum reported total system memory.
 	// The 0 value indicates no maximum.
-	MaximumTotalMemoryBytes uint64
+	maximumTotalMemoryBytes atomicbitops.Uint64
 )
 
+// SetTotalMemory sets the total system memory reported to the application to
+// bytes. It may be called while the application is running.
+func SetTotalMemory(bytes uint64) {
+	minimumTotalMemoryBytes.Store(bytes)
+	maximumTotalMemoryBytes.Store(bytes)
+}
+
 // TotalMemory returns the "total usable memory" available.
 //
 // This number doesn't really have a true value so it's based on the following
-// inputs and further bounded to be above the MinumumTotalMemoryBytes and below
-// MaximumTotalMemoryBytes.
+// inputs and further bounded to be above the minimum and below the maximum
+// total memory set by SetTotalMemory.
 //
 // memSize should be the platform.Memory size reported by platform.Memory.TotalSize()
 // used is the total memory reported by MemoryLocked.Total()
 func TotalMemory(memSize, used uint64) uint64 {
-	if memSize < MinimumTotalMemoryBytes {
-		memSize = MinimumTotalMemoryBytes
+	if minSize := minimumTotalMemoryBytes.Load(); memSize < minSize {
+		memSize = minSize
 	}
 	if memSize < used {
 		memSize = used
@@ -301,8 +307,8 @@ func TotalMemory(memSize, used uint64) uint64 {
 			memSize = uint64(1) << (uint(msb) + 1)
 		}
 	}
-	if MaximumTotalMemoryBytes > 0 && memSize > MaximumTotalMemoryBytes {
-		memSize = MaximumTotalMemoryBytes
+	if maxSize := maximumTotalMemoryBytes.Load(); maxSize > 0 && memSize > maxSize {
+		memSize = maxSize
 	}
 	return memSize
 }
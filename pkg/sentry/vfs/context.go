@@ -27,6 +27,9 @@ const (
 
 	// CtxRoot is a Context.Value key for a VFS root.
 	CtxRoot
+
+	// CtxFDInstaller is a Context.Value key for an FDInstaller.
+	CtxFDInstaller
 )
 
 // MountNamespaceFromContext returns the MountNamespace used by ctx. If ctx is
@@ -97,3 +100,23 @@ func (rc rootContext) Value(key interface{}) interface{} {
 		return rc.Context.Value(key)
 	}
 }
+
+// FDInstaller installs FileDescriptions in a file descriptor table.
+type FDInstaller interface {
+	// InstallFD installs fd at the lowest available file descriptor and
+	// returns that file descriptor. InstallFD takes a reference on fd.
+	InstallFD(ctx context.Context, fd *FileDescription, closeOnExec bool) (int32, error)
+
+	// RemoveFD removes the file descriptor fdnum previously returned by
+	// InstallFD.
+	RemoveFD(ctx context.Context, fdnum int32)
+}
+
+// FDInstallerFromContext returns the FDInstaller for the file descriptor table
+// used by ctx, or nil if ctx is not associated with one.
+func FDInstallerFromContext(ctx context.Context) FDInstaller {
+	if v := ctx.Value(CtxFDInstaller); v != nil {
+		return v.(FDInstaller)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// newDetachedMountNamespaceLocked makes mnt the root of a new detached mount
+// tree, which is not part of any task's mount namespace. The tree holds the
+// caller's reference on mnt until it is attached by MoveMountAt or dissolved
+// by closing the file description returned by NewDetachedMountFD. It is
+// analogous to Linux's fs/namespace.c:alloc_mnt_ns(anon=true).
+//
+// Preconditions: mnt must be disconnected and not belong to any
+// MountNamespace.
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) newDetachedMountNamespaceLocked(owner *auth.UserNamespace, mnt *Mount) *MountNamespace {
+	mntns := &MountNamespace{
+		Owner:       owner,
+		root:        mnt,
+		detached:    true,
+		mountpoints: make(map[*Dentry]uint32),
+	}
+	mnt.ns = mntns
+	return mntns
+}
+
+// NewDetachedMountTree returns a detached mount tree consisting of a single
+// Mount of fs with the given root, as for fsmount(2). A reference is taken on
+// the returned Mount.
+func (vfs *VirtualFilesystem) NewDetachedMountTree(creds *auth.Credentials, fs *Filesystem, root *Dentry, opts *MountOptions) *Mount {
+	mnt := vfs.NewDisconnectedMount(fs, root, opts)
+	vfs.mountMu.Lock()
+	defer vfs.mountMu.Unlock()
+	vfs.newDetachedMountNamespaceLocked(creds.UserNamespace, mnt)
+	mnt.IncRef()
+	return mnt
+}
+
+// CloneMountTreeAt returns a detached mount tree whose root is a clone of the
+// mount at pop, rooted at the dentry at pop, as for
+// open_tree(OPEN_TREE_CLONE). If recursive is true, mounts below pop are also
+// cloned into the tree, as for AT_RECURSIVE. A reference is taken on the
+// returned Mount.
+func (vfs *VirtualFilesystem) CloneMountTreeAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation, recursive bool) (*Mount, error) {
+	vd, err := vfs.GetDentryAt(ctx, creds, pop, &GetDentryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer vd.DecRef(ctx)
+
+	var submounts []*Mount
+	if recursive {
+		submounts = vfs.reachableChildMounts(ctx, vd)
+	}
+	// Mount.DecRef() may lock vfs.mountMu, so this must run after the unlock
+	// below.
+	defer func() {
+		for _, mnt := range submounts {
+			mnt.DecRef(ctx)
+		}
+	}()
+
+	mntns := MountNamespaceFromContext(ctx)
+	if mntns != nil {
+		defer mntns.DecRef(ctx)
+	}
+	vfs.mountMu.Lock()
+	defer vfs.mountMu.Unlock()
+	// Compare Linux's fs/namespace.c:open_detached_copy(): only mounts in the
+	// caller's mount namespace or in detached trees may be cloned.
+	if vd.mount.umounted || vd.mount.ns == nil || (mntns != nil && vd.mount.ns != mntns && !vd.mount.ns.detached) {
+		return nil, linuxerr.EINVAL
+	}
+	clone := vfs.cloneMount(vd.mount, vd.dentry, nil)
+	vfs.newDetachedMountNamespaceLocked(creds.UserNamespace, clone)
+	for _, mnt := range submounts {
+		if mnt.umounted || mnt.parent() != vd.mount {
+			// Raced with umount.
+			continue
+		}
+		vfs.cloneSubmountLocked(ctx, mnt, clone)
+	}
+	clone.IncRef()
+	return clone, nil
+}
+
+// NewDetachedMountFD returns an O_PATH file description for the root of mnt,
+// which must be the root of a detached mount tree returned by
+// NewDetachedMountTree or CloneMountTreeAt. When the file description is
+// released, the tree is unmounted unless it has been attached by MoveMountAt.
+func (vfs *VirtualFilesystem) NewDetachedMountFD(mnt *Mount, flags uint32) (*FileDescription, error) {
+	fd := &opathFD{detached: mnt.ns}
+	if err := fd.vfsfd.Init(fd, linux.O_PATH|flags, mnt, mnt.root, &FileDescriptionOptions{}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// dissolveDetachedMountTree unmounts the detached mount tree of mntns, unless
+// it has already been attached. It is analogous to Linux's
+// fs/namespace.c:dissolve_on_fput().
+func (vfs *VirtualFilesystem) dissolveDetachedMountTree(ctx context.Context, mntns *MountNamespace) {
+	vfs.mountMu.Lock()
+	mnt := mntns.root
+	if mnt == nil {
+		vfs.mountMu.Unlock()
+		return
+	}
+	mntns.root = nil
+	vfs.mounts.seq.BeginWrite()
+	vdsToDecRef, mountsToDecRef := vfs.umountRecursiveLocked(mnt, &umountRecursiveOptions{
+		disconnectHierarchy: true,
+	}, nil, nil)
+	vfs.mounts.seq.EndWrite()
+	vfs.mountMu.Unlock()
+	for _, vd := range vdsToDecRef {
+		vd.DecRef(ctx)
+	}
+	for _, m := range mountsToDecRef {
+		m.DecRef(ctx)
+	}
+}
+
+// setMountNamespaceLocked moves the descendants of mnt to mntns.
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) setMountNamespaceLocked(mnt *Mount, mntns *MountNamespace) {
+	for child := range mnt.children {
+		point := child.point()
+		oldns := child.ns
+		oldns.mountpoints[point]--
+		if oldns.mountpoints[point] == 0 {
+			delete(oldns.mountpoints, point)
+		}
+		mntns.mountpoints[point]++
+		child.ns = mntns
+		vfs.setMountNamespaceLocked(child, mntns)
+	}
+}
+
+// MoveMountAt moves the mount at from, which must be the root of a mount, so
+// that it's mounted at to, as for move_mount(2). If from is the root of a
+// detached mount tree, the tree is attached at to; otherwise, from and to must
+// be in the caller's mount namespace.
+func (vfs *VirtualFilesystem) MoveMountAt(ctx context.Context, creds *auth.Credentials, from, to *PathOperation) error {
+	fromVd, err := vfs.GetDentryAt(ctx, creds, from, &GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+	// See the similar defer in UmountAt for why this is in a closure.
+	defer func() {
+		fromVd.DecRef(ctx)
+	}()
+	if fromVd.dentry.isMounted() {
+		if realmnt := vfs.getMountAt(ctx, fromVd.mount, fromVd.dentry); realmnt != nil {
+			fromVd.mount.DecRef(ctx)
+			fromVd.mount = realmnt
+		}
+	} else if fromVd.dentry != fromVd.mount.root {
+		return linuxerr.EINVAL
+	}
+	// connectMountAt consumes the reference on toVd, so it's dropped
+	// explicitly on other paths.
+	toVd, err := vfs.GetDentryAt(ctx, creds, to, &GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+
+	mntns := MountNamespaceFromContext(ctx)
+	if mntns != nil {
+		defer mntns.DecRef(ctx)
+	}
+	var oldVd VirtualDentry
+	vfs.mountMu.Lock()
+	err = vfs.moveMountLocked(ctx, mntns, fromVd.mount, toVd, &oldVd)
+	vfs.mountMu.Unlock()
+	if oldVd.Ok() {
+		oldVd.DecRef(ctx)
+	}
+	return err
+}
+
+// moveMountLocked implements MoveMountAt. It consumes the reference on toVd.
+// If mnt is moved from another mount point, its old mount point is returned
+// in oldVd with a reference held, which the caller must drop after unlocking
+// vfs.mountMu.
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) moveMountLocked(ctx context.Context, mntns *MountNamespace, mnt *Mount, toVd VirtualDentry, oldVd *VirtualDentry) error {
+	// Mounts that aren't in a mount namespace, e.g. those of anonymous
+	// files, can't be moved.
+	if mnt.umounted || mnt.ns == nil || toVd.mount.umounted {
+		toVd.DecRef(ctx)
+		return linuxerr.EINVAL
+	}
+	if mntns != nil && toVd.mount.ns != mntns {
+		toVd.DecRef(ctx)
+		return linuxerr.EINVAL
+	}
+	// Mounts can't be moved below themselves.
+	for m := toVd.mount; m != nil; m = m.parent() {
+		if m == mnt {
+			toVd.DecRef(ctx)
+			return linuxerr.ELOOP
+		}
+	}
+
+	if detachedns := mnt.ns; detachedns.detached {
+		if detachedns.root != mnt {
+			// mnt is a submount within a detached tree.
+			toVd.DecRef(ctx)
+			return linuxerr.EINVAL
+		}
+		tree := vfs.preparePropagationTree(mnt, toVd)
+		if err := vfs.connectMountAt(ctx, mnt, toVd); err != nil {
+			vfs.abortPropagationTree(ctx, tree)
+			return err
+		}
+		vfs.commitPropagationTree(ctx, tree)
+		vfs.setMountNamespaceLocked(mnt, mnt.ns)
+		detachedns.root = nil
+		// connectMountAt took the reference that the mount tree now holds
+		// on mnt, replacing the one held by the detached tree. This can't
+		// drop the last reference, since we're holding one.
+		mnt.DecRef(ctx)
+		return nil
+	}
+
+	if (mntns != nil && mnt.ns != mntns) || mnt == mnt.ns.root || mnt.parent() == nil {
+		toVd.DecRef(ctx)
+		return linuxerr.EINVAL
+	}
+	// Compare Linux's fs/namespace.c:do_move_mount(): mounts with shared
+	// parents can't be moved, since that would have to be propagated.
+	if mnt.parent().propType == Shared {
+		toVd.DecRef(ctx)
+		return linuxerr.EINVAL
+	}
+	vfs.mounts.seq.BeginWrite()
+	*oldVd = vfs.disconnectLocked(mnt)
+	vfs.mounts.seq.EndWrite()
+	tree := vfs.preparePropagationTree(mnt, toVd)
+	if err := vfs.connectMountAt(ctx, mnt, toVd); err != nil {
+		vfs.abortPropagationTree(ctx, tree)
+		// Put mnt back where it was. connectLocked consumes the reference
+		// on the old mount point, and takes another on mnt.
+		oldVd.dentry.mu.Lock()
+		vfs.mounts.seq.BeginWrite()
+		vfs.connectLocked(mnt, *oldVd, mnt.ns)
+		vfs.mounts.seq.EndWrite()
+		oldVd.dentry.mu.Unlock()
+		*oldVd = VirtualDentry{}
+		mnt.DecRef(ctx)
+		return err
+	}
+	vfs.commitPropagationTree(ctx, tree)
+	// connectMountAt took another reference on mnt on behalf of the mount
+	// tree, which already held one.
+	mnt.DecRef(ctx)
+	return nil
+}
@@ -237,6 +237,11 @@ func (ep *EpollInstance) AddInterest(file *FileDescription, num int32, event lin
 
 	// Check for cyclic polling if necessary.
 	subep, _ := file.impl.(*EpollInstance)
+	// "EINVAL: EPOLLEXCLUSIVE was specified in event and fd refers to an
+	// epoll instance." - epoll_ctl(2)
+	if event.Events&linux.EPOLLEXCLUSIVE != 0 && (subep != nil || event.Events&^linux.EPOLLEXCLUSIVE_OK_BITS != 0) {
+		return linuxerr.EINVAL
+	}
 	if subep != nil {
 		epollCycleMu.Lock()
 		// epollCycleMu must be locked for the rest of AddInterest to ensure
@@ -267,12 +272,12 @@ func (ep *EpollInstance) AddInterest(file *FileDescription, num int32, event lin
 		mask:     mask,
 		userData: event.Data,
 	}
-	ep.interest[key] = epi
 	wmask := waiter.EventMaskFromLinux(mask)
-	epi.waiter.Init(epi, wmask)
+	epi.initWaiter(wmask)
 	if err := file.EventRegister(&epi.waiter); err != nil {
 		return err
 	}
+	ep.interest[key] = epi
 
 	// Check if the file is already ready.
 	if m := file.Readiness(wmask) & wmask; m != 0 {
@@ -320,6 +325,12 @@ func (ep *EpollInstance) mightPollRecursive(ep2 *EpollInstance, remainingRecursi
 //
 // Preconditions: A reference must be held on file.
 func (ep *EpollInstance) ModifyInterest(file *FileDescription, num int32, event linux.EpollEvent) error {
+	// Linux: fs/eventpoll.c:do_epoll_ctl() fails EPOLL_CTL_MOD with
+	// EPOLLEXCLUSIVE before looking up the registration.
+	if event.Events&linux.EPOLLEXCLUSIVE != 0 {
+		return linuxerr.EINVAL
+	}
+
 	ep.interestMu.Lock()
 	defer ep.interestMu.Unlock()
 
@@ -331,6 +342,10 @@ func (ep *EpollInstance) ModifyInterest(file *FileDescription, num int32, event
 	if !ok {
 		return linuxerr.ENOENT
 	}
+	// Exclusive registrations can't be modified.
+	if epi.mask&linux.EPOLLEXCLUSIVE != 0 {
+		return linuxerr.EINVAL
+	}
 
 	// Update epi for the next call to ep.ReadEvents().
 	mask := event.Events | linux.EPOLLERR | linux.EPOLLHUP
@@ -340,8 +355,14 @@ func (ep *EpollInstance) ModifyInterest(file *FileDescription, num int32, event
 	// Re-register with the new mask.
 	file.EventUnregister(&epi.waiter)
 	wmask := waiter.EventMaskFromLinux(mask)
-	epi.waiter.Init(epi, wmask)
+	epi.initWaiter(wmask)
 	if err := file.EventRegister(&epi.waiter); err != nil {
+		// epi is no longer registered with file; forget about it, so that
+		// it isn't unregistered again by DeleteInterest or Release.
+		ep.removeLocked(epi)
+		file.epollMu.Lock()
+		delete(file.epolls, epi)
+		file.epollMu.Unlock()
 		return err
 	}
 
@@ -382,6 +403,17 @@ func (ep *EpollInstance) DeleteInterest(file *FileDescription, num int32) error
 	return nil
 }
 
+// initWaiter initializes epi.waiter to be notified of events in wmask.
+//
+// Preconditions: epi.waiter must not be registered.
+func (epi *epollInterest) initWaiter(wmask waiter.EventMask) {
+	if epi.mask&linux.EPOLLEXCLUSIVE != 0 {
+		epi.waiter.InitExclusive(epi, wmask)
+	} else {
+		epi.waiter.Init(epi, wmask)
+	}
+}
+
 // NotifyEvent implements waiter.EventListener.NotifyEvent.
 func (epi *epollInterest) NotifyEvent(waiter.EventMask) {
 	newReady := false
@@ -398,6 +430,18 @@ func (epi *epollInterest) NotifyEvent(waiter.EventMask) {
 	}
 }
 
+// NotifyEventExclusive implements
+// waiter.ExclusiveEventListener.NotifyEventExclusive.
+func (epi *epollInterest) NotifyEventExclusive(mask waiter.EventMask) bool {
+	epi.NotifyEvent(mask)
+	// Linux stops at the first EPOLLEXCLUSIVE registration whose mask
+	// matches the event, even if no task is waiting on its epoll instance.
+	// Only consider the event consumed if a task is waiting, so that events
+	// aren't left pending on an instance whose tasks are all busy while
+	// those waiting on other instances stay asleep.
+	return !epi.epoll.q.IsEmpty()
+}
+
 // Preconditions: ep.interestMu must be locked.
 func (ep *EpollInstance) removeLocked(epi *epollInterest) {
 	delete(ep.interest, epi.key)
@@ -409,9 +453,26 @@ func (ep *EpollInstance) removeLocked(epi *epollInterest) {
 	ep.readyMu.Unlock()
 }
 
-// ReadEvents appends up to maxReady events to events and returns the updated
-// slice of events.
-func (ep *EpollInstance) ReadEvents(events []linux.EpollEvent, maxEvents int) []linux.EpollEvent {
+// MaybeReady returns true if ep has interests that may be ready. Unlike
+// Readiness, it doesn't check the readiness of the interests' files, so it is
+// cheap enough to busy poll.
+func (ep *EpollInstance) MaybeReady() bool {
+	ep.readyMu.Lock()
+	defer ep.readyMu.Unlock()
+	return !ep.ready.Empty()
+}
+
+// ReadEvents collects up to maxEvents ready events, using events as a buffer,
+// and passes them to deliver, which returns the number of events that it
+// delivered to the application; ReadEvents returns the same number, or 0 if
+// no events were ready. Events are only consumed once they are delivered: in
+// particular, EPOLLONESHOT registrations are only disabled, and
+// edge-triggered readiness only cleared, for delivered events, so that events
+// that could not be copied out are reported by the next call to ReadEvents.
+//
+// deliver is called with ep.interestMu locked, so that delivery can't race
+// with EPOLL_CTL_MOD; it must not call any EpollInstance methods.
+func (ep *EpollInstance) ReadEvents(events []linux.EpollEvent, maxEvents int, deliver func([]linux.EpollEvent) int) int {
 	// We can't call FileDescription.Readiness() while holding ep.readyMu.
 	// Instead, hold ep.interestMu to prevent changes to the set of
 	// epollInterests, then temporarily move all epollInterests already on
@@ -421,24 +482,27 @@ func (ep *EpollInstance) ReadEvents(events []linux.EpollEvent, maxEvents int) []
 	ep.interestMu.Lock()
 	defer ep.interestMu.Unlock()
 	var (
-		ready    epollInterestList
-		notReady epollInterestList
-		requeue  epollInterestList
+		ready       epollInterestList
+		notReady    epollInterestList
+		requeue     epollInterestList
+		undelivered epollInterestList
 	)
 	ep.readyMu.Lock()
 	ready.PushBackList(&ep.ready)
 	ep.readySeq++
 	ep.readyMu.Unlock()
 	if ready.Empty() {
-		return nil
+		return 0
 	}
 	defer func() {
 		notify := false
 		ep.readyMu.Lock()
-		// epollInterests that we never checked are re-inserted at the start of
-		// ep.ready. epollInterests that were ready are re-inserted at the end
-		// for reasons described by EpollInstance.ready.
+		// epollInterests that we never checked, or whose events weren't
+		// delivered, are re-inserted at the start of ep.ready.
+		// epollInterests that were ready are re-inserted at the end for
+		// reasons described by EpollInstance.ready.
 		ep.ready.PushFrontList(&ready)
+		ep.ready.PushFrontList(&undelivered)
 		var next *epollInterest
 		for epi := notReady.Front(); epi != nil; epi = next {
 			next = epi.Next()
@@ -452,15 +516,22 @@ func (ep *EpollInstance) ReadEvents(events []linux.EpollEvent, maxEvents int) []
 			}
 		}
 		ep.ready.PushBackList(&requeue)
+		notify = notify || !undelivered.Empty()
 		ep.readyMu.Unlock()
 		if notify {
 			ep.q.Notify(waiter.ReadableEvents)
 		}
 	}()
 
-	i := 0
+	// Allocate space for a few epollInterests on the stack for the common
+	// case in which we don't have too many events.
+	var (
+		readyEpisArr [16]*epollInterest
+		readyEpis    = readyEpisArr[:0]
+	)
+	events = events[:0]
 	var next *epollInterest
-	for epi := ready.Front(); epi != nil; epi = next {
+	for epi := ready.Front(); epi != nil && len(readyEpis) < maxEvents; epi = next {
 		next = epi.Next()
 		// Regardless of what else happens, epi is initially removed from the
 		// ready list.
@@ -472,6 +543,25 @@ func (ep *EpollInstance) ReadEvents(events []linux.EpollEvent, maxEvents int) []
 			notReady.PushBack(epi)
 			continue
 		}
+		// Report ievents.
+		events = append(events, linux.EpollEvent{
+			Events: ievents.ToLinux(),
+			Data:   epi.userData,
+		})
+		readyEpis = append(readyEpis, epi)
+	}
+	if len(readyEpis) == 0 {
+		return 0
+	}
+
+	n := deliver(events)
+	for i, epi := range readyEpis {
+		if i >= n {
+			// Leave epi ready, ahead of epollInterests that we never
+			// checked.
+			undelivered.PushBack(epi)
+			continue
+		}
 		// Determine what we should do with epi.
 		switch {
 		case epi.mask&linux.EPOLLONESHOT != 0:
@@ -486,15 +576,6 @@ func (ep *EpollInstance) ReadEvents(events []linux.EpollEvent, maxEvents int) []
 			// Queue epi to be moved to the end of the ready list.
 			requeue.PushBack(epi)
 		}
-		// Report ievents.
-		events = append(events, linux.EpollEvent{
-			Events: ievents.ToLinux(),
-			Data:   epi.userData,
-		})
-		i++
-		if i == maxEvents {
-			break
-		}
 	}
-	return events
+	return n
 }
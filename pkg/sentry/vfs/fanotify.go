@@ -0,0 +1,611 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// FanotifyEvents is the set of fanotify events that may be generated by VFS.
+// Permission events are not supported.
+const FanotifyEvents = linux.FAN_OPEN | linux.FAN_MODIFY | linux.FAN_CLOSE
+
+// fanotifyEventFlags is the set of file status flags that may be passed as
+// the event_f_flags argument to fanotify_init(2).
+const fanotifyEventFlags = linux.O_ACCMODE | linux.O_APPEND | linux.O_DSYNC | linux.O_NOATIME | linux.O_NONBLOCK | linux.O_SYNC | linux.O_LARGEFILE | linux.O_CLOEXEC
+
+// Fanotify represents a fanotify group created by fanotify_init(2). Fanotify
+// implements FileDescriptionImpl.
+//
+// Only notification groups (FAN_CLASS_NOTIF) are supported.
+//
+// +stateify savable
+type Fanotify struct {
+	vfsfd FileDescription
+	FileDescriptionDefaultImpl
+	DentryMetadataFileDescriptionImpl
+	NoLockFD
+
+	// queue is used to notify interested parties when the fanotify group
+	// becomes readable.
+	queue waiter.Queue
+
+	// eventFlags are the file status flags used to open the file descriptions
+	// returned with events, from the event_f_flags argument to
+	// fanotify_init(2). eventFlags is immutable.
+	eventFlags uint32
+
+	// maxEvents is the maximum number of pending events. If maxEvents is 0,
+	// the number of pending events is unlimited. maxEvents is immutable.
+	maxEvents int
+
+	// maxMarks is the maximum number of marks. If maxMarks is 0, the number of
+	// marks is unlimited. maxMarks is immutable.
+	maxMarks int
+
+	// mu protects the fields below.
+	mu fanotifyMutex `state:"nosave"`
+
+	// inodeMarks contains marks on inodes, keyed by the Dentry at which the
+	// mark was added. A reference is held on each Dentry in inodeMarks.
+	inodeMarks map[*Dentry]*fanotifyMark
+
+	// mountMarks contains marks on mounts. References are not held on the
+	// Mounts in mountMarks, so that marks do not prevent unmounting; marks on
+	// Mounts that have been unmounted never match any events.
+	mountMarks map[*Mount]*fanotifyMark
+
+	// evMu protects the fields below. evMu is separate from mu so that
+	// queueing events does not contend with changes to marks.
+	evMu fanotifyEventMutex `state:"nosave"`
+
+	// events is the list of pending events.
+	events fanotifyEventList
+
+	// numEvents is the number of events in events.
+	numEvents int
+
+	// overflowQueued is true if events contains a FAN_Q_OVERFLOW event.
+	overflowQueued bool
+}
+
+var _ FileDescriptionImpl = (*Fanotify)(nil)
+
+// fanotifyMark represents a mark added by fanotify_mark(2).
+//
+// +stateify savable
+type fanotifyMark struct {
+	// mask is the set of events reported by the mark.
+	mask uint64
+
+	// ignoredMask is the set of events suppressed by the mark, including
+	// events reported by other marks in the same group.
+	ignoredMask uint64
+
+	// survModify is true if ignoredMask is preserved when the marked object is
+	// modified, as for FAN_MARK_IGNORED_SURV_MODIFY.
+	survModify bool
+}
+
+// empty returns true if m no longer has any effect.
+func (m *fanotifyMark) empty() bool {
+	return m.mask == 0 && m.ignoredMask == 0
+}
+
+// fanotifyEvent represents a pending fanotify event.
+//
+// +stateify savable
+type fanotifyEvent struct {
+	fanotifyEventEntry
+
+	// mask is the set of events that occurred.
+	mask uint64
+
+	// vd is the object on which the events occurred. A reference is held on
+	// vd. vd is not Ok() for FAN_Q_OVERFLOW events.
+	vd VirtualDentry
+
+	// pid is the thread group ID of the process that caused the events.
+	pid int32
+}
+
+// NewFanotifyFD constructs a new Fanotify group. flags and eventFlags are the
+// arguments to fanotify_init(2).
+func NewFanotifyFD(ctx context.Context, vfsObj *VirtualFilesystem, flags, eventFlags uint32) (*FileDescription, error) {
+	// FAN_CLOEXEC affects file descriptors, so it must be handled outside of
+	// vfs.
+	flags &^= linux.FAN_CLOEXEC
+	if flags&^(linux.FAN_NONBLOCK|linux.FAN_ALL_CLASS_BITS|linux.FAN_UNLIMITED_QUEUE|linux.FAN_UNLIMITED_MARKS) != 0 {
+		return nil, linuxerr.EINVAL
+	}
+	// Permission events, which are only reported to FAN_CLASS_CONTENT and
+	// FAN_CLASS_PRE_CONTENT groups, are not supported.
+	if flags&linux.FAN_ALL_CLASS_BITS != linux.FAN_CLASS_NOTIF {
+		return nil, linuxerr.EINVAL
+	}
+	if eventFlags&^fanotifyEventFlags != 0 || eventFlags&linux.O_ACCMODE == linux.O_ACCMODE {
+		return nil, linuxerr.EINVAL
+	}
+	// Linux's __O_SYNC (which we call linux.O_SYNC) implies O_DSYNC.
+	if eventFlags&linux.O_SYNC != 0 {
+		eventFlags |= linux.O_DSYNC
+	}
+
+	vd := vfsObj.NewAnonVirtualDentry("[fanotify]")
+	defer vd.DecRef(ctx)
+	fd := &Fanotify{
+		eventFlags: eventFlags,
+		maxEvents:  linux.FANOTIFY_DEFAULT_MAX_EVENTS,
+		maxMarks:   linux.FANOTIFY_DEFAULT_MAX_MARKS,
+		inodeMarks: make(map[*Dentry]*fanotifyMark),
+		mountMarks: make(map[*Mount]*fanotifyMark),
+	}
+	if flags&linux.FAN_UNLIMITED_QUEUE != 0 {
+		fd.maxEvents = 0
+	}
+	if flags&linux.FAN_UNLIMITED_MARKS != 0 {
+		fd.maxMarks = 0
+	}
+	var statusFlags uint32 = linux.O_RDWR
+	if flags&linux.FAN_NONBLOCK != 0 {
+		statusFlags |= linux.O_NONBLOCK
+	}
+	if err := fd.vfsfd.Init(fd, statusFlags, vd.Mount(), vd.Dentry(), &FileDescriptionOptions{
+		UseDentryMetadata: true,
+		DenyPRead:         true,
+		DenyPWrite:        true,
+	}); err != nil {
+		return nil, err
+	}
+	// Like Linux, operations on the fanotify file description itself do not
+	// generate fanotify events.
+	fd.vfsfd.noFanotify = true
+	return &fd.vfsfd, nil
+}
+
+// Release implements FileDescriptionImpl.Release. Release removes all marks
+// and discards all pending events.
+func (f *Fanotify) Release(ctx context.Context) {
+	// Once f is unregistered, no new events are queued.
+	vfsObj := f.vfsfd.vd.mount.vfs
+	vfsObj.fanotifyGroupsMu.Lock()
+	if _, ok := vfsObj.fanotifyGroups[f]; ok {
+		delete(vfsObj.fanotifyGroups, f)
+		vfsObj.numFanotifyGroups.Add(-1)
+	}
+	vfsObj.fanotifyGroupsMu.Unlock()
+
+	f.mu.Lock()
+	for d := range f.inodeMarks {
+		d.DecRef(ctx)
+	}
+	f.inodeMarks = nil
+	f.mountMarks = nil
+	f.mu.Unlock()
+
+	f.evMu.Lock()
+	for ev := f.events.Front(); ev != nil; ev = f.events.Front() {
+		f.events.Remove(ev)
+		if ev.vd.Ok() {
+			ev.vd.DecRef(ctx)
+		}
+	}
+	f.numEvents = 0
+	f.overflowQueued = false
+	f.evMu.Unlock()
+}
+
+// Allocate implements FileDescription.Allocate.
+func (f *Fanotify) Allocate(ctx context.Context, mode, offset, length uint64) error {
+	return linuxerr.ENODEV
+}
+
+// EventRegister implements waiter.Waitable.
+func (f *Fanotify) EventRegister(e *waiter.Entry) error {
+	f.queue.EventRegister(e)
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.
+func (f *Fanotify) EventUnregister(e *waiter.Entry) {
+	f.queue.EventUnregister(e)
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+//
+// Readiness indicates whether there are pending events for a fanotify group.
+func (f *Fanotify) Readiness(mask waiter.EventMask) waiter.EventMask {
+	ready := waiter.EventMask(0)
+
+	f.evMu.Lock()
+	defer f.evMu.Unlock()
+
+	if !f.events.Empty() {
+		ready |= waiter.ReadableEvents
+	}
+
+	return mask & ready
+}
+
+// Epollable implements FileDescriptionImpl.Epollable.
+func (f *Fanotify) Epollable() bool {
+	return true
+}
+
+// PRead implements FileDescriptionImpl.PRead.
+func (*Fanotify) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts ReadOptions) (int64, error) {
+	return 0, linuxerr.ESPIPE
+}
+
+// PWrite implements FileDescriptionImpl.PWrite.
+func (*Fanotify) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts WriteOptions) (int64, error) {
+	return 0, linuxerr.ESPIPE
+}
+
+// Write implements FileDescriptionImpl.Write.
+//
+// Writes to fanotify groups are responses to permission events, which are not
+// supported.
+func (*Fanotify) Write(ctx context.Context, src usermem.IOSequence, opts WriteOptions) (int64, error) {
+	return 0, linuxerr.EINVAL
+}
+
+// Read implements FileDescriptionImpl.Read.
+func (f *Fanotify) Read(ctx context.Context, dst usermem.IOSequence, opts ReadOptions) (int64, error) {
+	if dst.NumBytes() < linux.FAN_EVENT_METADATA_LEN {
+		return 0, linuxerr.EINVAL
+	}
+
+	var writeLen int64
+	for dst.NumBytes() >= linux.FAN_EVENT_METADATA_LEN {
+		// Like Linux, dequeue each event before copying it out, so that
+		// evMu isn't held while opening the file description for the
+		// event.
+		f.evMu.Lock()
+		ev := f.events.Front()
+		if ev == nil {
+			f.evMu.Unlock()
+			break
+		}
+		f.events.Remove(ev)
+		f.numEvents--
+		if !ev.vd.Ok() {
+			f.overflowQueued = false
+		}
+		f.evMu.Unlock()
+
+		n, err := f.copyOutEvent(ctx, ev, dst)
+		if err != nil {
+			if writeLen > 0 {
+				return writeLen, nil
+			}
+			return 0, err
+		}
+		writeLen += n
+		dst = dst.DropFirst64(n)
+	}
+	if writeLen == 0 {
+		// Nothing to read yet, tell caller to block.
+		return 0, linuxerr.ErrWouldBlock
+	}
+	return writeLen, nil
+}
+
+// copyOutEvent serializes ev to dst, installing a file descriptor for the
+// object at which the event occurred in the caller's file descriptor table.
+// copyOutEvent consumes the reference held by ev.
+func (f *Fanotify) copyOutEvent(ctx context.Context, ev *fanotifyEvent, dst usermem.IOSequence) (int64, error) {
+	meta := linux.FanotifyEventMetadata{
+		EventLen:    linux.FAN_EVENT_METADATA_LEN,
+		Vers:        linux.FANOTIFY_METADATA_VERSION,
+		MetadataLen: linux.FAN_EVENT_METADATA_LEN,
+		Mask:        ev.mask,
+		FD:          linux.FAN_NOFD,
+		PID:         ev.pid,
+	}
+	var installer FDInstaller
+	if ev.vd.Ok() {
+		defer ev.vd.DecRef(ctx)
+		installer = FDInstallerFromContext(ctx)
+		if installer == nil {
+			return 0, linuxerr.EINVAL
+		}
+		file, err := f.openEventFile(ctx, ev.vd)
+		if err != nil {
+			return 0, err
+		}
+		fdnum, err := installer.InstallFD(ctx, file, f.eventFlags&linux.O_CLOEXEC != 0)
+		file.DecRef(ctx)
+		if err != nil {
+			return 0, err
+		}
+		meta.FD = fdnum
+	}
+
+	var buf [linux.FAN_EVENT_METADATA_LEN]byte
+	meta.MarshalUnsafe(buf[:])
+	n, err := dst.CopyOut(ctx, buf[:])
+	if err != nil {
+		if meta.FD != linux.FAN_NOFD {
+			installer.RemoveFD(ctx, meta.FD)
+		}
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// openEventFile returns a new file description for vd, opened with the flags
+// requested by fanotify_init(2). Operations on the returned file description
+// do not generate fanotify events.
+func (f *Fanotify) openEventFile(ctx context.Context, vd VirtualDentry) (*FileDescription, error) {
+	// Open vd directly rather than through VirtualFilesystem.OpenAt, which
+	// would generate a FAN_OPEN event for the new file description.
+	vfsObj := vd.mount.vfs
+	rp := vfsObj.getResolvingPath(auth.CredentialsFromContext(ctx), &PathOperation{
+		Root:  vd,
+		Start: vd,
+	})
+	fd, err := vd.mount.fs.impl.OpenAt(ctx, rp, OpenOptions{
+		Flags: f.eventFlags &^ linux.O_CLOEXEC,
+	})
+	rp.Release(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fd.noFanotify = true
+	return fd, nil
+}
+
+// Ioctl implements FileDescriptionImpl.Ioctl.
+func (f *Fanotify) Ioctl(ctx context.Context, uio usermem.IO, args arch.SyscallArguments) (uintptr, error) {
+	switch args[1].Int() {
+	case linux.FIONREAD:
+		f.evMu.Lock()
+		n := uint32(f.numEvents * linux.FAN_EVENT_METADATA_LEN)
+		f.evMu.Unlock()
+		var buf [4]byte
+		hostarch.ByteOrder.PutUint32(buf[:], n)
+		_, err := uio.CopyOut(ctx, args[2].Pointer(), buf[:], usermem.IOOpts{})
+		return 0, err
+
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// AddMark adds the events in mask to the mark on vd's Dentry, or to the mark
+// on vd's Mount if flags contains FAN_MARK_MOUNT, creating the mark if it
+// doesn't exist. flags and mask are as for fanotify_mark(2) with
+// FAN_MARK_ADD.
+//
+// The caller must hold a reference on vd.
+func (f *Fanotify) AddMark(vd VirtualDentry, flags uint32, mask uint64) error {
+	// Register f before taking f.mu to preserve lock ordering with
+	// FileDescription.notifyFanotify. f remains registered until it is
+	// released, even if all of its marks are removed.
+	f.register()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var m *fanotifyMark
+	if flags&linux.FAN_MARK_MOUNT != 0 {
+		m = f.mountMarks[vd.mount]
+	} else {
+		m = f.inodeMarks[vd.dentry]
+	}
+	if m == nil {
+		if f.maxMarks != 0 && len(f.inodeMarks)+len(f.mountMarks) >= f.maxMarks {
+			return linuxerr.ENOSPC
+		}
+		m = &fanotifyMark{}
+		if flags&linux.FAN_MARK_MOUNT != 0 {
+			f.mountMarks[vd.mount] = m
+		} else {
+			vd.dentry.IncRef()
+			f.inodeMarks[vd.dentry] = m
+		}
+	}
+	if flags&linux.FAN_MARK_IGNORED_MASK != 0 {
+		m.ignoredMask |= mask
+		if flags&linux.FAN_MARK_IGNORED_SURV_MODIFY != 0 {
+			m.survModify = true
+		}
+	} else {
+		m.mask |= mask
+	}
+	return nil
+}
+
+// RemoveMark removes the events in mask from the mark on vd's Dentry, or from
+// the mark on vd's Mount if flags contains FAN_MARK_MOUNT, and removes the
+// mark if it no longer has any events. flags and mask are as for
+// fanotify_mark(2) with FAN_MARK_REMOVE.
+//
+// The caller must hold a reference on vd.
+func (f *Fanotify) RemoveMark(ctx context.Context, vd VirtualDentry, flags uint32, mask uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var m *fanotifyMark
+	if flags&linux.FAN_MARK_MOUNT != 0 {
+		m = f.mountMarks[vd.mount]
+	} else {
+		m = f.inodeMarks[vd.dentry]
+	}
+	if m == nil {
+		return linuxerr.ENOENT
+	}
+	if flags&linux.FAN_MARK_IGNORED_MASK != 0 {
+		m.ignoredMask &^= mask
+	} else {
+		m.mask &^= mask
+	}
+	if !m.empty() {
+		return nil
+	}
+	if flags&linux.FAN_MARK_MOUNT != 0 {
+		delete(f.mountMarks, vd.mount)
+	} else {
+		delete(f.inodeMarks, vd.dentry)
+		vd.dentry.DecRef(ctx)
+	}
+	return nil
+}
+
+// FlushMarks removes all marks on mounts if flags contains FAN_MARK_MOUNT,
+// and all marks on inodes otherwise, as for fanotify_mark(2) with
+// FAN_MARK_FLUSH.
+func (f *Fanotify) FlushMarks(ctx context.Context, flags uint32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if flags&linux.FAN_MARK_MOUNT != 0 {
+		f.mountMarks = make(map[*Mount]*fanotifyMark)
+		return
+	}
+	for d := range f.inodeMarks {
+		d.DecRef(ctx)
+	}
+	f.inodeMarks = make(map[*Dentry]*fanotifyMark)
+}
+
+// register adds f to the set of fanotify groups that receive events.
+func (f *Fanotify) register() {
+	vfsObj := f.vfsfd.vd.mount.vfs
+	vfsObj.fanotifyGroupsMu.Lock()
+	defer vfsObj.fanotifyGroupsMu.Unlock()
+	if _, ok := vfsObj.fanotifyGroups[f]; ok {
+		return
+	}
+	if vfsObj.fanotifyGroups == nil {
+		vfsObj.fanotifyGroups = make(map[*Fanotify]struct{})
+	}
+	vfsObj.fanotifyGroups[f] = struct{}{}
+	vfsObj.numFanotifyGroups.Add(1)
+}
+
+// handleEvent queues an event for the events in mask, which occurred at vd,
+// if they are reported by f's marks.
+func (f *Fanotify) handleEvent(vd VirtualDentry, mask uint64, isDir bool, pid int32) {
+	var marked, ignored uint64
+	f.mu.Lock()
+	for _, m := range [...]*fanotifyMark{f.inodeMarks[vd.dentry], f.mountMarks[vd.mount]} {
+		if m == nil {
+			continue
+		}
+		// "The ignore mask is cleared when the file is modified unless
+		// FAN_MARK_IGNORED_SURV_MODIFY was specified" - fanotify_mark(2). As
+		// in Linux, this happens before the ignore mask is applied to the
+		// modification itself.
+		if mask&linux.FAN_MODIFY != 0 && !m.survModify {
+			m.ignoredMask = 0
+		}
+		marked |= m.mask
+		ignored |= m.ignoredMask
+	}
+	f.mu.Unlock()
+
+	// Events on directories are only reported to marks that include
+	// FAN_ONDIR.
+	if isDir && marked&linux.FAN_ONDIR == 0 {
+		return
+	}
+	events := mask & marked &^ ignored & FanotifyEvents
+	if events == 0 {
+		return
+	}
+	if isDir {
+		events |= linux.FAN_ONDIR
+	}
+	f.queueEvent(vd, events, pid)
+}
+
+// queueEvent queues an event for the events in mask, which occurred at vd.
+func (f *Fanotify) queueEvent(vd VirtualDentry, mask uint64, pid int32) {
+	f.evMu.Lock()
+
+	// Like Linux, merge events for the same object and process that haven't
+	// been read yet. Linux considers more than the last pending event, but
+	// this is sufficient for the common sequences of open, modify and close.
+	if last := f.events.Back(); last != nil && last.vd == vd && last.pid == pid {
+		last.mask |= mask
+		f.evMu.Unlock()
+		return
+	}
+
+	if f.maxEvents != 0 && f.numEvents >= f.maxEvents {
+		// Drop the event, and report that events were dropped with a single
+		// FAN_Q_OVERFLOW event.
+		if f.overflowQueued {
+			f.evMu.Unlock()
+			return
+		}
+		f.events.PushBack(&fanotifyEvent{
+			mask: linux.FAN_Q_OVERFLOW,
+		})
+		f.numEvents++
+		f.overflowQueued = true
+		f.evMu.Unlock()
+		f.queue.Notify(waiter.ReadableEvents)
+		return
+	}
+
+	vd.IncRef()
+	f.events.PushBack(&fanotifyEvent{
+		mask: mask,
+		vd:   vd,
+		pid:  pid,
+	})
+	f.numEvents++
+
+	// Release mutex before notifying waiters because we don't control what
+	// they can do.
+	f.evMu.Unlock()
+
+	f.queue.Notify(waiter.ReadableEvents)
+}
+
+// notifyFanotify generates fanotify events for the events in mask, which
+// occurred on fd.
+func (fd *FileDescription) notifyFanotify(ctx context.Context, mask uint64) {
+	vfsObj := fd.vd.mount.vfs
+	if fd.noFanotify || vfsObj.numFanotifyGroups.Load() == 0 {
+		return
+	}
+
+	// Directories can't be opened for writing, so only FAN_OPEN and
+	// FAN_CLOSE_NOWRITE events can occur on them. Avoid the cost of Stat for
+	// other events.
+	isDir := false
+	if mask&(linux.FAN_OPEN|linux.FAN_CLOSE_NOWRITE) != 0 {
+		stat, err := fd.Stat(ctx, StatOptions{Mask: linux.STATX_TYPE})
+		isDir = err == nil && stat.Mask&linux.STATX_TYPE != 0 && stat.Mode&linux.S_IFMT == linux.S_IFDIR
+	}
+	pid, _ := auth.ThreadGroupIDFromContext(ctx)
+
+	vfsObj.fanotifyGroupsMu.RLock()
+	defer vfsObj.fanotifyGroupsMu.RUnlock()
+	for f := range vfsObj.fanotifyGroups {
+		f.handleEvent(fd.vd, mask, isDir, pid)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fs/lock"
 	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
@@ -86,6 +87,13 @@ type FileDescription struct {
 
 	usedLockBSD atomicbitops.Uint32
 
+	// noFanotify is true if operations on this FileDescription do not
+	// generate fanotify events. noFanotify is immutable.
+	//
+	// noFanotify is analogous to Linux's FMODE_NONOTIFY, except that it does
+	// not suppress inotify events.
+	noFanotify bool
+
 	// impl is the FileDescriptionImpl associated with this Filesystem. impl is
 	// immutable. This should be the last field in FileDescription.
 	impl FileDescriptionImpl
@@ -161,10 +169,13 @@ func (fd *FileDescription) DecRef(ctx context.Context) {
 	fd.FileDescriptionRefs.DecRef(func() {
 		// Generate inotify events.
 		ev := uint32(linux.IN_CLOSE_NOWRITE)
+		fev := uint64(linux.FAN_CLOSE_NOWRITE)
 		if fd.IsWritable() {
 			ev = linux.IN_CLOSE_WRITE
+			fev = linux.FAN_CLOSE_WRITE
 		}
 		fd.Dentry().InotifyWithParent(ctx, ev, 0, PathEvent)
+		fd.notifyFanotify(ctx, fev)
 
 		// Unregister fd from all epoll instances.
 		fd.epollMu.Lock()
@@ -585,6 +596,7 @@ func (fd *FileDescription) Allocate(ctx context.Context, mode, offset, length ui
 		return err
 	}
 	fd.Dentry().InotifyWithParent(ctx, linux.IN_MODIFY, 0, PathEvent)
+	fd.notifyFanotify(ctx, linux.FAN_MODIFY)
 	return nil
 }
 
@@ -662,6 +674,7 @@ func (fd *FileDescription) PWrite(ctx context.Context, src usermem.IOSequence, o
 	n, err := fd.impl.PWrite(ctx, src, offset, opts)
 	if n > 0 {
 		fd.Dentry().InotifyWithParent(ctx, linux.IN_MODIFY, 0, PathEvent)
+		fd.notifyFanotify(ctx, linux.FAN_MODIFY)
 	}
 	return n, err
 }
@@ -674,6 +687,7 @@ func (fd *FileDescription) Write(ctx context.Context, src usermem.IOSequence, op
 	n, err := fd.impl.Write(ctx, src, opts)
 	if n > 0 {
 		fd.Dentry().InotifyWithParent(ctx, linux.IN_MODIFY, 0, PathEvent)
+		fd.notifyFanotify(ctx, linux.FAN_MODIFY)
 	}
 	return n, err
 }
@@ -905,6 +919,58 @@ func (fd *FileDescription) ComputeLockRange(ctx context.Context, start uint64, l
 	return lock.ComputeRange(int64(start), int64(length), off)
 }
 
+// FileDescriptionImplFadviseExtension is an optional extension to
+// FileDescriptionImpl for files that act on posix_fadvise(2) advice.
+type FileDescriptionImplFadviseExtension interface {
+	// Fadvise applies advice, one of linux.POSIX_FADV_*, to offsets
+	// [offset, offset+length) of the file. If length is 0, the advice applies
+	// to all offsets from offset to the end of the file. offset may be
+	// negative. advice has already been validated.
+	Fadvise(ctx context.Context, offset, length int64, advice int32) error
+}
+
+// Fadvise applies advice to offsets [offset, offset+length) of the file, as
+// for posix_fadvise(2). Advice given to files whose FileDescriptionImpl
+// doesn't implement FileDescriptionImplFadviseExtension is ignored.
+func (fd *FileDescription) Fadvise(ctx context.Context, offset, length int64, advice int32) error {
+	if ext, ok := fd.impl.(FileDescriptionImplFadviseExtension); ok {
+		return ext.Fadvise(ctx, offset, length, advice)
+	}
+	return nil
+}
+
+// FileDescriptionImplCacheStatExtension is an optional extension to
+// FileDescriptionImpl for files whose contents may be cached in sentry memory.
+type FileDescriptionImplCacheStatExtension interface {
+	// CacheStat returns the state of the cache for offsets mr of the file,
+	// as for cachestat(2). mr is page-aligned.
+	CacheStat(ctx context.Context, mr memmap.MappableRange) (memmap.CacheStat, error)
+}
+
+// CacheStat returns the state of the cache for offsets mr of the file, as for
+// cachestat(2). mr must be page-aligned.
+//
+// Files whose FileDescriptionImpl doesn't implement
+// FileDescriptionImplCacheStatExtension are reported to be entirely cached,
+// consistently with mincore(2) on mappings of Mappables that don't implement
+// memmap.CachedMappable.
+func (fd *FileDescription) CacheStat(ctx context.Context, mr memmap.MappableRange) (memmap.CacheStat, error) {
+	if ext, ok := fd.impl.(FileDescriptionImplCacheStatExtension); ok {
+		return ext.CacheStat(ctx, mr)
+	}
+	stat, err := fd.Stat(ctx, StatOptions{Mask: linux.STATX_SIZE})
+	if err != nil {
+		return memmap.CacheStat{}, err
+	}
+	if end, ok := hostarch.PageRoundUp(stat.Size); ok && end < mr.End {
+		mr.End = end
+	}
+	if mr.Start >= mr.End {
+		return memmap.CacheStat{}, nil
+	}
+	return memmap.CacheStat{Cache: mr.Length() / hostarch.PageSize}, nil
+}
+
 // A FileAsync sends signals to its owner when w is ready for IO. This is only
 // implemented by pkg/sentry/fasync:FileAsync, but we unfortunately need this
 // interface to avoid circular dependencies.
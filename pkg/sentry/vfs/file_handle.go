@@ -0,0 +1,128 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// fileHandleMountIDSize is the size of the mount ID prefix of file handles
+// returned by VirtualFilesystem.NameToHandleAt.
+const fileHandleMountIDSize = 8
+
+// FileHandle is an opaque identifier for a file, as returned by
+// name_to_handle_at(2).
+type FileHandle struct {
+	// Type is the handle type reported to applications.
+	Type int32
+
+	// Bytes is the contents of the handle. The first fileHandleMountIDSize
+	// bytes are the ID of the mount through which the handle was obtained;
+	// the remainder is provided by the filesystem.
+	Bytes []byte
+}
+
+// FilesystemImplFileHandleExtension is an optional extension to
+// FilesystemImpl that allows files to be identified by file handles.
+type FilesystemImplFileHandleExtension interface {
+	// EncodeFileHandle returns the type and contents of a file handle that
+	// identifies the file represented by d. The handle must remain valid for
+	// as long as the file exists, including across save/restore.
+	//
+	// Preconditions: d belongs to this filesystem.
+	EncodeFileHandle(ctx context.Context, d *Dentry) (int32, []byte, error)
+
+	// DecodeFileHandle returns a Dentry representing the file identified by
+	// a handle previously returned by EncodeFileHandle, with a reference
+	// taken on it. If the file no longer exists, DecodeFileHandle returns
+	// ESTALE.
+	DecodeFileHandle(ctx context.Context, typ int32, b []byte) (*Dentry, error)
+}
+
+// NameToHandleAt returns a file handle for the file at the given path, and the
+// ID of the mount containing it.
+func (vfs *VirtualFilesystem) NameToHandleAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation) (FileHandle, uint64, error) {
+	vd, err := vfs.GetDentryAt(ctx, creds, pop, &GetDentryOptions{})
+	if err != nil {
+		return FileHandle{}, 0, err
+	}
+	defer vd.DecRef(ctx)
+	ext, ok := vd.mount.fs.impl.(FilesystemImplFileHandleExtension)
+	if !ok {
+		return FileHandle{}, 0, linuxerr.EOPNOTSUPP
+	}
+	typ, b, err := ext.EncodeFileHandle(ctx, vd.dentry)
+	if err != nil {
+		return FileHandle{}, 0, err
+	}
+	buf := make([]byte, fileHandleMountIDSize+len(b))
+	hostarch.ByteOrder.PutUint64(buf, vd.mount.ID)
+	copy(buf[fileHandleMountIDSize:], b)
+	return FileHandle{
+		Type:  typ,
+		Bytes: buf,
+	}, vd.mount.ID, nil
+}
+
+// OpenByHandleAt returns a FileDescription for the file identified by fh,
+// which must have been returned by NameToHandleAt for a mount of the same
+// filesystem as mntVD's mount. As in Linux, the returned FileDescription is
+// associated with mntVD's mount. A reference is taken on the returned
+// FileDescription.
+//
+// Permission checks are the responsibility of the caller.
+func (vfs *VirtualFilesystem) OpenByHandleAt(ctx context.Context, creds *auth.Credentials, root, mntVD VirtualDentry, fh FileHandle, opts *OpenOptions) (*FileDescription, error) {
+	if len(fh.Bytes) < fileHandleMountIDSize {
+		return nil, linuxerr.ESTALE
+	}
+	mnt := mntVD.mount
+	if id := hostarch.ByteOrder.Uint64(fh.Bytes); id != mnt.ID && !vfs.mountOfFilesystemExists(root, id, mnt.fs) {
+		return nil, linuxerr.ESTALE
+	}
+	ext, ok := mnt.fs.impl.(FilesystemImplFileHandleExtension)
+	if !ok {
+		return nil, linuxerr.ESTALE
+	}
+	d, err := ext.DecodeFileHandle(ctx, fh.Type, fh.Bytes[fileHandleMountIDSize:])
+	if err != nil {
+		return nil, err
+	}
+	defer d.DecRef(ctx)
+	return vfs.OpenAt(ctx, creds, &PathOperation{
+		Root: root,
+		Start: VirtualDentry{
+			mount:  mnt,
+			dentry: d,
+		},
+		Path: fspath.Path{},
+	}, opts)
+}
+
+// mountOfFilesystemExists returns true if a mount with the given ID of fs is
+// reachable from root's mount.
+func (vfs *VirtualFilesystem) mountOfFilesystemExists(root VirtualDentry, id uint64, fs *Filesystem) bool {
+	vfs.mountMu.Lock()
+	defer vfs.mountMu.Unlock()
+	for _, mnt := range root.mount.submountsLocked() {
+		if mnt.ID == id {
+			return mnt.fs == fs
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// filesystemContextPhase is the phase of a FilesystemContext, analogous to
+// Linux's enum fs_context_phase.
+type filesystemContextPhase int
+
+const (
+	// fsContextDefining is the phase in which the filesystem's options are
+	// being set.
+	fsContextDefining filesystemContextPhase = iota
+
+	// fsContextCreated is the phase after the filesystem has been created,
+	// in which it can be mounted.
+	fsContextCreated
+
+	// fsContextMounted is the phase after the filesystem has been mounted,
+	// after which the FilesystemContext can't be used.
+	fsContextMounted
+
+	// fsContextFailed is the phase after creating the filesystem failed.
+	fsContextFailed
+)
+
+// FilesystemContext represents a filesystem configuration context created by
+// fsopen(2), which is configured by fsconfig(2) and mounted by fsmount(2).
+// FilesystemContext implements FileDescriptionImpl.
+//
+// +stateify savable
+type FilesystemContext struct {
+	vfsfd FileDescription
+	FileDescriptionDefaultImpl
+	DentryMetadataFileDescriptionImpl
+	NoLockFD
+
+	// fsType is the name of the filesystem type. fsType is immutable.
+	fsType string
+
+	// mu protects the fields below.
+	mu filesystemContextMutex `state:"nosave"`
+
+	phase filesystemContextPhase
+
+	// source is the source of the filesystem, as the source argument to
+	// mount(2).
+	source string
+
+	// options are the filesystem's options, in the format of the data
+	// argument to mount(2) once joined by commas.
+	options []string
+
+	// fs and root are the created filesystem and its root, if phase is
+	// fsContextCreated. References are held on both.
+	fs   *Filesystem
+	root *Dentry
+}
+
+var _ FileDescriptionImpl = (*FilesystemContext)(nil)
+
+// NewFilesystemContextFD returns a new FilesystemContext for a filesystem of
+// type fsType, which must be mountable by users.
+func NewFilesystemContextFD(ctx context.Context, vfsObj *VirtualFilesystem, fsType string) (*FileDescription, error) {
+	if rft := vfsObj.getFilesystemType(fsType); rft == nil || !rft.opts.AllowUserMount {
+		return nil, linuxerr.ENODEV
+	}
+
+	vd := vfsObj.NewAnonVirtualDentry("[fscontext]")
+	defer vd.DecRef(ctx)
+	fd := &FilesystemContext{fsType: fsType}
+	if err := fd.vfsfd.Init(fd, linux.O_RDWR, vd.Mount(), vd.Dentry(), &FileDescriptionOptions{
+		UseDentryMetadata: true,
+		DenyPRead:         true,
+		DenyPWrite:        true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// Release implements FileDescriptionImpl.Release.
+func (c *FilesystemContext) Release(ctx context.Context) {
+	c.mu.Lock()
+	fs, root := c.fs, c.root
+	c.fs, c.root = nil, nil
+	c.mu.Unlock()
+	if root != nil {
+		root.DecRef(ctx)
+	}
+	if fs != nil {
+		fs.DecRef(ctx)
+	}
+}
+
+// SetFlag sets the flag option key, as for fsconfig(FSCONFIG_SET_FLAG).
+func (c *FilesystemContext) SetFlag(key string) error {
+	return c.setOption(key, key)
+}
+
+// SetString sets option key to value, as for fsconfig(FSCONFIG_SET_STRING).
+func (c *FilesystemContext) SetString(key, value string) error {
+	if key == "source" {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.phase != fsContextDefining {
+			return linuxerr.EBUSY
+		}
+		if c.source != "" {
+			// Compare Linux's fs/fs_context.c:vfs_parse_fs_param_source().
+			return linuxerr.EINVAL
+		}
+		c.source = value
+		return nil
+	}
+	return c.setOption(key, key+"="+value)
+}
+
+func (c *FilesystemContext) setOption(key, opt string) error {
+	if key == "" || strings.Contains(opt, ",") {
+		return linuxerr.EINVAL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.phase != fsContextDefining {
+		return linuxerr.EBUSY
+	}
+	c.options = append(c.options, opt)
+	return nil
+}
+
+// Create creates the filesystem configured by c, as for
+// fsconfig(FSCONFIG_CMD_CREATE).
+func (c *FilesystemContext) Create(ctx context.Context, creds *auth.Credentials) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.phase != fsContextDefining {
+		return linuxerr.EBUSY
+	}
+	opts := MountOptions{
+		GetFilesystemOptions: GetFilesystemOptions{
+			Data: strings.Join(c.options, ","),
+		},
+	}
+	fs, root, err := c.vfsfd.vd.mount.vfs.NewFilesystem(ctx, creds, c.source, c.fsType, &opts)
+	if err != nil {
+		c.phase = fsContextFailed
+		return err
+	}
+	c.fs, c.root = fs, root
+	c.phase = fsContextCreated
+	return nil
+}
+
+// Mount returns a detached mount tree containing the filesystem created by c,
+// as for fsmount(2). A reference is taken on the returned Mount.
+func (c *FilesystemContext) Mount(creds *auth.Credentials, opts *MountOptions) (*Mount, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.phase {
+	case fsContextCreated:
+	case fsContextMounted:
+		return nil, linuxerr.EBUSY
+	default:
+		return nil, linuxerr.EINVAL
+	}
+	mnt := c.vfsfd.vd.mount.vfs.NewDetachedMountTree(creds, c.fs, c.root, opts)
+	c.phase = fsContextMounted
+	return mnt, nil
+}
@@ -0,0 +1,303 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"path"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// LandlockRuleset represents a Landlock ruleset created by
+// landlock_create_ruleset(2). LandlockRuleset implements FileDescriptionImpl.
+//
+// +stateify savable
+type LandlockRuleset struct {
+	vfsfd FileDescription
+	FileDescriptionDefaultImpl
+	DentryMetadataFileDescriptionImpl
+	NoLockFD
+
+	// handledAccessFS is the set of filesystem access rights restricted by
+	// the ruleset. handledAccessFS is immutable.
+	handledAccessFS uint64
+
+	// mu protects rules.
+	mu landlockRulesetMutex `state:"nosave"`
+
+	// rules maps the absolute pathnames of files to the access rights granted
+	// beneath them.
+	rules map[string]uint64
+}
+
+var _ FileDescriptionImpl = (*LandlockRuleset)(nil)
+
+// NewLandlockRulesetFD returns a new Landlock ruleset that restricts the
+// filesystem access rights in handledAccessFS.
+func NewLandlockRulesetFD(ctx context.Context, vfsObj *VirtualFilesystem, handledAccessFS uint64) (*FileDescription, error) {
+	if handledAccessFS == 0 {
+		return nil, linuxerr.ENOMSG
+	}
+	if handledAccessFS&^linux.LANDLOCK_MASK_ACCESS_FS != 0 {
+		return nil, linuxerr.EINVAL
+	}
+
+	vd := vfsObj.NewAnonVirtualDentry("[landlock-ruleset]")
+	defer vd.DecRef(ctx)
+	fd := &LandlockRuleset{
+		handledAccessFS: handledAccessFS,
+		rules:           make(map[string]uint64),
+	}
+	if err := fd.vfsfd.Init(fd, linux.O_RDWR, vd.Mount(), vd.Dentry(), &FileDescriptionOptions{
+		UseDentryMetadata: true,
+		DenyPRead:         true,
+		DenyPWrite:        true,
+	}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// Release implements FileDescriptionImpl.Release.
+func (r *LandlockRuleset) Release(context.Context) {}
+
+// AddPathBeneathRule grants allowedAccess to the file represented by parent
+// and, if it is a directory, to everything beneath it, as for
+// landlock_add_rule(LANDLOCK_RULE_PATH_BENEATH).
+func (r *LandlockRuleset) AddPathBeneathRule(ctx context.Context, parent *FileDescription, allowedAccess uint64) error {
+	// "ENOMSG: Empty accesses (e.g. rule_attr->allowed_access is 0)" -
+	// landlock_add_rule(2)
+	if allowedAccess == 0 {
+		return linuxerr.ENOMSG
+	}
+	if allowedAccess&^r.handledAccessFS != 0 {
+		return linuxerr.EINVAL
+	}
+	stat, err := parent.Stat(ctx, StatOptions{Mask: linux.STATX_TYPE})
+	if err != nil {
+		return err
+	}
+	// Access rights that only apply to directories can't be granted on other
+	// files.
+	if stat.Mode&linux.S_IFMT != linux.S_IFDIR && allowedAccess&^linux.LANDLOCK_ACCESS_FILE != 0 {
+		return linuxerr.EINVAL
+	}
+	vfsObj := parent.vd.mount.vfs
+	p, err := vfsObj.landlockPathname(ctx, parent.vd)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules[p] |= allowedAccess
+	return nil
+}
+
+// Layer returns a copy of r for enforcement by landlock_restrict_self(2).
+func (r *LandlockRuleset) Layer() auth.LandlockLayer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rules := make(map[string]uint64, len(r.rules))
+	for p, access := range r.rules {
+		rules[p] = access
+	}
+	return auth.LandlockLayer{
+		HandledAccessFS: r.handledAccessFS,
+		Rules:           rules,
+	}
+}
+
+// landlockPathname returns the pathname that is matched against Landlock
+// rules for vd. Pathnames are relative to the root of the mount tree rather
+// than to the caller's root directory, so that rules added before chroot(2)
+// still apply after it.
+func (vfs *VirtualFilesystem) landlockPathname(ctx context.Context, vd VirtualDentry) (string, error) {
+	return vfs.PathnameWithDeleted(ctx, VirtualDentry{}, vd)
+}
+
+// checkLandlockAccess returns EACCES if the Landlock domain of creds does not
+// grant access to the file at vd.
+func (vfs *VirtualFilesystem) checkLandlockAccess(ctx context.Context, creds *auth.Credentials, vd VirtualDentry, access uint64) error {
+	p, err := vfs.landlockPathname(ctx, vd)
+	if err != nil {
+		return err
+	}
+	if !creds.LandlockDomain.Allowed(p, access) {
+		return linuxerr.EACCES
+	}
+	return nil
+}
+
+// checkLandlockParentAccess returns EACCES if the Landlock domain of creds
+// does not grant access to the directory containing the file at pop. Landlock
+// checks access rights to create or remove files on the parent directory.
+func (vfs *VirtualFilesystem) checkLandlockParentAccess(ctx context.Context, creds *auth.Credentials, pop *PathOperation, access uint64) error {
+	parentVD, _, err := vfs.getParentDirAndName(ctx, creds, pop)
+	if err != nil {
+		return err
+	}
+	defer parentVD.DecRef(ctx)
+	return vfs.checkLandlockAccess(ctx, creds, parentVD, access)
+}
+
+// checkLandlockOpen returns EACCES if the Landlock domain of creds does not
+// grant the access rights needed to open fd with opts.
+func (vfs *VirtualFilesystem) checkLandlockOpen(ctx context.Context, creds *auth.Credentials, fd *FileDescription, opts *OpenOptions) error {
+	var access uint64
+	if fd.IsReadable() {
+		stat, err := fd.Stat(ctx, StatOptions{Mask: linux.STATX_TYPE})
+		if err != nil {
+			return err
+		}
+		if stat.Mode&linux.S_IFMT == linux.S_IFDIR {
+			access |= linux.LANDLOCK_ACCESS_FS_READ_DIR
+		} else {
+			access |= linux.LANDLOCK_ACCESS_FS_READ_FILE
+		}
+	}
+	if fd.IsWritable() {
+		access |= linux.LANDLOCK_ACCESS_FS_WRITE_FILE
+	}
+	if opts.FileExec {
+		access |= linux.LANDLOCK_ACCESS_FS_EXECUTE
+	}
+	if access == 0 {
+		return nil
+	}
+	return vfs.checkLandlockAccess(ctx, creds, fd.VirtualDentry(), access)
+}
+
+// checkLandlockCreate returns EACCES if the file at pop doesn't exist and the
+// Landlock domain of creds does not allow creating it, as for open(O_CREAT).
+func (vfs *VirtualFilesystem) checkLandlockCreate(ctx context.Context, creds *auth.Credentials, pop *PathOperation) error {
+	typ, err := vfs.landlockFileType(ctx, creds, pop)
+	if err != nil || typ != 0 {
+		return err
+	}
+	return vfs.checkLandlockParentAccess(ctx, creds, pop, linux.LANDLOCK_ACCESS_FS_MAKE_REG)
+}
+
+// checkLandlockLink returns an error if the Landlock domain of creds does not
+// allow linking oldVD, the file at oldpop, to newpop.
+func (vfs *VirtualFilesystem) checkLandlockLink(ctx context.Context, creds *auth.Credentials, oldVD VirtualDentry, oldpop, newpop *PathOperation) error {
+	newParentVD, _, err := vfs.getParentDirAndName(ctx, creds, newpop)
+	if err != nil {
+		return err
+	}
+	defer newParentVD.DecRef(ctx)
+	oldPath, err := vfs.landlockPathname(ctx, oldVD)
+	if err != nil {
+		return err
+	}
+	newParentPath, err := vfs.landlockPathname(ctx, newParentVD)
+	if err != nil {
+		return err
+	}
+	// Like Landlock ABI version 1, forbid reparenting files, since it could
+	// be used to move files out of the subtrees that restrict them.
+	if path.Dir(oldPath) != newParentPath {
+		return linuxerr.EXDEV
+	}
+	stat, err := vfs.StatAt(ctx, creds, oldpop, &StatOptions{Mask: linux.STATX_TYPE})
+	if err != nil {
+		return err
+	}
+	if !creds.LandlockDomain.Allowed(newParentPath, landlockMakeAccess(stat.Mode&linux.S_IFMT)) {
+		return linuxerr.EACCES
+	}
+	return nil
+}
+
+// checkLandlockRename returns an error if the Landlock domain of creds does
+// not allow renaming the file at oldpop, in oldParentVD, to newpop.
+func (vfs *VirtualFilesystem) checkLandlockRename(ctx context.Context, creds *auth.Credentials, oldParentVD VirtualDentry, oldpop, newpop *PathOperation) error {
+	newParentVD, _, err := vfs.getParentDirAndName(ctx, creds, newpop)
+	if err != nil {
+		return err
+	}
+	defer newParentVD.DecRef(ctx)
+	// See checkLandlockLink. This also means that RENAME_EXCHANGE doesn't need
+	// to be handled differently.
+	if oldParentVD.dentry != newParentVD.dentry {
+		return linuxerr.EXDEV
+	}
+	oldType, err := vfs.landlockFileType(ctx, creds, oldpop)
+	if err != nil {
+		return err
+	}
+	if oldType == 0 {
+		return linuxerr.ENOENT
+	}
+	newType, err := vfs.landlockFileType(ctx, creds, newpop)
+	if err != nil {
+		return err
+	}
+	access := landlockRemoveAccess(oldType) | landlockRemoveAccess(newType) | landlockMakeAccess(oldType)
+	return vfs.checkLandlockAccess(ctx, creds, oldParentVD, access)
+}
+
+// landlockFileType returns the type of the file at pop, or 0 if it doesn't
+// exist.
+func (vfs *VirtualFilesystem) landlockFileType(ctx context.Context, creds *auth.Credentials, pop *PathOperation) (uint16, error) {
+	stat, err := vfs.StatAt(ctx, creds, pop, &StatOptions{Mask: linux.STATX_TYPE})
+	if err != nil {
+		if linuxerr.Equals(linuxerr.ENOENT, err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return stat.Mode & linux.S_IFMT, nil
+}
+
+// landlockMakeAccess returns the access right needed to create a file of the
+// given type.
+func landlockMakeAccess(typ uint16) uint64 {
+	switch typ {
+	case linux.S_IFLNK:
+		return linux.LANDLOCK_ACCESS_FS_MAKE_SYM
+	case 0, linux.S_IFREG:
+		return linux.LANDLOCK_ACCESS_FS_MAKE_REG
+	case linux.S_IFDIR:
+		return linux.LANDLOCK_ACCESS_FS_MAKE_DIR
+	case linux.S_IFCHR:
+		return linux.LANDLOCK_ACCESS_FS_MAKE_CHAR
+	case linux.S_IFBLK:
+		return linux.LANDLOCK_ACCESS_FS_MAKE_BLOCK
+	case linux.S_IFIFO:
+		return linux.LANDLOCK_ACCESS_FS_MAKE_FIFO
+	case linux.S_IFSOCK:
+		return linux.LANDLOCK_ACCESS_FS_MAKE_SOCK
+	default:
+		return 0
+	}
+}
+
+// landlockRemoveAccess returns the access right needed to remove a file of
+// the given type, or 0 if typ is 0, indicating that there is no file to
+// remove.
+func landlockRemoveAccess(typ uint16) uint64 {
+	switch typ {
+	case 0:
+		return 0
+	case linux.S_IFDIR:
+		return linux.LANDLOCK_ACCESS_FS_REMOVE_DIR
+	default:
+		return linux.LANDLOCK_ACCESS_FS_REMOVE_FILE
+	}
+}
@@ -93,9 +93,11 @@ type Mount struct {
 	// ID is the immutable mount ID.
 	ID uint64
 
-	// Flags contains settings as specified for mount(2), e.g. MS_NOEXEC, except
-	// for MS_RDONLY which is tracked in "writers". Immutable.
-	Flags MountFlags
+	// flags contains settings as specified for mount(2), e.g. MS_NOEXEC,
+	// except for MS_RDONLY which is tracked in "writers", encoded by
+	// MountFlags.bits(). flags is accessed using atomic memory operations,
+	// and is only changed with VirtualFilesystem.mountMu locked.
+	flags atomicbitops.Uint32
 
 	// key is protected by VirtualFilesystem.mountMu and
 	// VirtualFilesystem.mounts.seq, and may be nil. References are held on
@@ -154,7 +156,7 @@ func (sharedMapper) linkerFor(mnt *Mount) *sharedEntry { return &mnt.sharedEntry
 func newMount(vfs *VirtualFilesystem, fs *Filesystem, root *Dentry, mntns *MountNamespace, opts *MountOptions) *Mount {
 	mnt := &Mount{
 		ID:       vfs.lastMountID.Add(1),
-		Flags:    opts.Flags,
+		flags:    atomicbitops.FromUint32(opts.Flags.bits()),
 		vfs:      vfs,
 		fs:       fs,
 		root:     root,
@@ -174,11 +176,39 @@ func (mnt *Mount) Options() MountOptions {
 	mnt.vfs.mountMu.Lock()
 	defer mnt.vfs.mountMu.Unlock()
 	return MountOptions{
-		Flags:    mnt.Flags,
+		Flags:    mnt.Flags(),
 		ReadOnly: mnt.ReadOnly(),
 	}
 }
 
+// Flags returns the mount flags currently applicable to mnt.
+func (mnt *Mount) Flags() MountFlags {
+	return mountFlagsFromBits(mnt.flags.Load())
+}
+
+// optionsString returns the per-mount options of mnt, as in the mount options
+// field of /proc/[pid]/mountinfo.
+func (mnt *Mount) optionsString() string {
+	opts := "rw"
+	if mnt.ReadOnly() {
+		opts = "ro"
+	}
+	flags := mnt.Flags()
+	if flags.NoSUID {
+		opts += ",nosuid"
+	}
+	if flags.NoDev {
+		opts += ",nodev"
+	}
+	if flags.NoExec {
+		opts += ",noexec"
+	}
+	if flags.NoATime {
+		opts += ",noatime"
+	}
+	return opts
+}
+
 func (mnt *Mount) generateOptionalTags() string {
 	mnt.vfs.mountMu.Lock()
 	defer mnt.vfs.mountMu.Unlock()
@@ -260,6 +290,14 @@ type MountNamespace struct {
 	// root is the MountNamespace's root mount.
 	root *Mount
 
+	// detached is true if the MountNamespace is the anonymous namespace of a
+	// detached mount tree, created by NewDetachedMountTree or
+	// CloneMountTreeAt, rather than the mount namespace of any task. root is
+	// the root of the detached tree until it is attached or dissolved, after
+	// which root is nil. detached is immutable; root is protected by
+	// VirtualFilesystem.mountMu if detached is true.
+	detached bool
+
 	// mountpoints maps all Dentries which are mount points in this namespace
 	// to the number of Mounts for which they are mount points. mountpoints is
 	// protected by VirtualFilesystem.mountMu.
@@ -501,6 +539,49 @@ func (vfs *VirtualFilesystem) SetMountPropagationAt(ctx context.Context, creds *
 	return nil
 }
 
+// FilesystemImplRemountExtension is an optional extension to FilesystemImpl
+// for filesystems whose options can be changed by remounting them.
+type FilesystemImplRemountExtension interface {
+	// Remount changes the filesystem's options to those in data, which has
+	// the same format as GetFilesystemOptions.Data.
+	Remount(ctx context.Context, creds *auth.Credentials, data string) error
+}
+
+// RemountAt changes the options of the mount pointed to by pop, which must be
+// the root of a mount. Unless bind is true, the options of the mounted
+// filesystem are also changed, if it implements
+// FilesystemImplRemountExtension.
+//
+// Of the mount flags, only ReadOnly can be changed by remounting.
+func (vfs *VirtualFilesystem) RemountAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation, bind bool, opts *MountOptions) error {
+	vd, err := vfs.GetDentryAt(ctx, creds, pop, &GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+	// See the similar defer in UmountAt for why this is in a closure.
+	defer func() {
+		vd.DecRef(ctx)
+	}()
+	if vd.dentry.isMounted() {
+		if realmnt := vfs.getMountAt(ctx, vd.mount, vd.dentry); realmnt != nil {
+			vd.mount.DecRef(ctx)
+			vd.mount = realmnt
+		}
+	} else if vd.dentry != vd.mount.root {
+		return linuxerr.EINVAL
+	}
+
+	// Compare fs/namespace.c:do_remount().
+	if !bind {
+		if ext, ok := vd.mount.fs.impl.(FilesystemImplRemountExtension); ok {
+			if err := ext.Remount(ctx, creds, opts.GetFilesystemOptions.Data); err != nil {
+				return err
+			}
+		}
+	}
+	return vfs.SetMountReadOnly(vd.mount, opts.ReadOnly)
+}
+
 // SetMountPropagation changes the propagation type of the mount.
 func (vfs *VirtualFilesystem) SetMountPropagation(mnt *Mount, propType PropagationType) {
 	vfs.mountMu.Lock()
@@ -537,7 +618,7 @@ func (vfs *VirtualFilesystem) cloneMount(mnt *Mount, root *Dentry, mopts *MountO
 	opts := mopts
 	if opts == nil {
 		opts = &MountOptions{
-			Flags:    mnt.Flags,
+			Flags:    mnt.Flags(),
 			ReadOnly: mnt.ReadOnly(),
 		}
 	}
@@ -546,10 +627,10 @@ func (vfs *VirtualFilesystem) cloneMount(mnt *Mount, root *Dentry, mopts *MountO
 
 // BindAt creates a clone of the source path's parent mount and mounts it at
 // the target path. The new mount's root dentry is one pointed to by the source
-// path.
-//
-// TODO(b/249121230): Support recursive bind mounting.
-func (vfs *VirtualFilesystem) BindAt(ctx context.Context, creds *auth.Credentials, source, target *PathOperation) (*Mount, error) {
+// path. If recursive is true, mounts below the source path are also cloned and
+// mounted at the corresponding locations below the target path, as for
+// MS_BIND|MS_REC.
+func (vfs *VirtualFilesystem) BindAt(ctx context.Context, creds *auth.Credentials, source, target *PathOperation, recursive bool) (*Mount, error) {
 	sourceVd, err := vfs.GetDentryAt(ctx, creds, source, &GetDentryOptions{})
 	if err != nil {
 		return nil, err
@@ -560,6 +641,18 @@ func (vfs *VirtualFilesystem) BindAt(ctx context.Context, creds *auth.Credential
 		return nil, err
 	}
 
+	var submounts []*Mount
+	if recursive {
+		submounts = vfs.reachableChildMounts(ctx, sourceVd)
+	}
+	// Mount.DecRef() may lock vfs.mountMu, so this must run after the unlock
+	// below.
+	defer func() {
+		for _, mnt := range submounts {
+			mnt.DecRef(ctx)
+		}
+	}()
+
 	vfs.mountMu.Lock()
 	defer vfs.mountMu.Unlock()
 	clone := vfs.cloneMount(sourceVd.mount, sourceVd.dentry, nil)
@@ -578,9 +671,97 @@ func (vfs *VirtualFilesystem) BindAt(ctx context.Context, creds *auth.Credential
 		return nil, err
 	}
 	vfs.commitPropagationTree(ctx, tree)
+	// TODO(b/249121230): Propagate cloned submounts to the peers of the
+	// target mount.
+	for _, mnt := range submounts {
+		if mnt.umounted || mnt.parent() != sourceVd.mount {
+			// Raced with umount.
+			continue
+		}
+		vfs.cloneSubmountLocked(ctx, mnt, clone)
+	}
 	return clone, nil
 }
 
+// reachableChildMounts returns the children of vd.mount whose mount points
+// are vd.dentry or its descendants. A reference is taken on each returned
+// Mount.
+//
+// Preconditions: References are held on vd.
+func (vfs *VirtualFilesystem) reachableChildMounts(ctx context.Context, vd VirtualDentry) []*Mount {
+	var (
+		children []*Mount
+		points   []*Dentry
+	)
+	vfs.mountMu.Lock()
+	for child := range vd.mount.children {
+		if child.umounted {
+			continue
+		}
+		child.IncRef()
+		children = append(children, child)
+		// The child holds a reference on its mount point while we hold
+		// vfs.mountMu, so this can't fail.
+		point := child.point()
+		point.IncRef()
+		points = append(points, point)
+	}
+	vfs.mountMu.Unlock()
+
+	// We can't hold vfs.mountMu while calling FilesystemImpl methods due to
+	// lock ordering, so check reachability now.
+	var reachable []*Mount
+	for i, child := range children {
+		point := points[i]
+		if vd.dentry == vd.mount.root || vfs.isReachableFrom(ctx, vd, point) {
+			reachable = append(reachable, child)
+		} else {
+			child.DecRef(ctx)
+		}
+		point.DecRef(ctx)
+	}
+	return reachable
+}
+
+// isReachableFrom returns true if d, which belongs to root.mount.fs, is
+// root.dentry or one of its descendants.
+//
+// Preconditions: References are held on root and d.
+func (vfs *VirtualFilesystem) isReachableFrom(ctx context.Context, root VirtualDentry, d *Dentry) bool {
+	b := getFSPathBuilder()
+	defer putFSPathBuilder(b)
+	err := root.mount.fs.impl.PrependPath(ctx, root, VirtualDentry{mount: root.mount, dentry: d}, b)
+	_, ok := err.(PrependPathAtVFSRootError)
+	return ok
+}
+
+// cloneSubmountLocked clones mnt and all of its descendants, and mounts the
+// clone of mnt at mnt's mount point in parent, which shares mnt's parent's
+// filesystem. It is analogous to a single step of Linux's
+// fs/namespace.c:copy_tree().
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) cloneSubmountLocked(ctx context.Context, mnt, parent *Mount) {
+	clone := vfs.cloneMount(mnt, mnt.root, nil)
+	defer clone.DecRef(ctx)
+	vd := VirtualDentry{
+		mount:  parent,
+		dentry: mnt.point(),
+	}
+	// connectMountAt consumes this reference.
+	vd.IncRef()
+	if err := vfs.connectMountAt(ctx, clone, vd); err != nil {
+		// The mount point was removed from parent.fs; there's nothing left
+		// to mount on.
+		return
+	}
+	for child := range mnt.children {
+		if !child.umounted {
+			vfs.cloneSubmountLocked(ctx, child, clone)
+		}
+	}
+}
+
 // MountAt creates and mounts a Filesystem configured by the given arguments.
 // The VirtualFilesystem will hold a reference to the Mount until it is
 // unmounted.
@@ -1283,16 +1464,7 @@ func (vfs *VirtualFilesystem) GenerateProcMounts(ctx context.Context, taskRootDi
 			break
 		}
 
-		opts := "rw"
-		if mnt.ReadOnly() {
-			opts = "ro"
-		}
-		if mnt.Flags.NoATime {
-			opts = ",noatime"
-		}
-		if mnt.Flags.NoExec {
-			opts += ",noexec"
-		}
+		opts := mnt.optionsString()
 		if mopts := mnt.fs.Impl().MountOptions(); mopts != "" {
 			opts += "," + mopts
 		}
@@ -1392,17 +1564,7 @@ func (vfs *VirtualFilesystem) GenerateProcMountInfo(ctx context.Context, taskRoo
 		fmt.Fprintf(buf, "%s ", manglePath(path))
 
 		// (6) Mount options.
-		opts := "rw"
-		if mnt.ReadOnly() {
-			opts = "ro"
-		}
-		if mnt.Flags.NoATime {
-			opts = ",noatime"
-		}
-		if mnt.Flags.NoExec {
-			opts += ",noexec"
-		}
-		fmt.Fprintf(buf, "%s ", opts)
+		fmt.Fprintf(buf, "%s ", mnt.optionsString())
 
 		// (7) Optional fields: zero or more fields of the form "tag[:value]".
 		fmt.Fprintf(buf, "%s ", mnt.generateOptionalTags())
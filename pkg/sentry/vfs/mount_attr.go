@@ -0,0 +1,145 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+// SetMountAttrOptions contains options to VirtualFilesystem.SetMountAttrAt().
+type SetMountAttrOptions struct {
+	// Set and Clear are the MOUNT_ATTR_* attributes to set and clear. Only
+	// MOUNT_ATTR_RDONLY, MOUNT_ATTR_NOSUID, MOUNT_ATTR_NODEV,
+	// MOUNT_ATTR_NOEXEC and MOUNT_ATTR__ATIME are supported. If Clear
+	// contains MOUNT_ATTR__ATIME, the access time mode is changed to the one
+	// in Set.
+	Set   uint64
+	Clear uint64
+
+	// Propagation is the new propagation type of the mounts. If it is
+	// Unknown, propagation types are unchanged.
+	Propagation PropagationType
+
+	// If Recursive is true, the attributes of all mounts below the mount are
+	// also changed, as for AT_RECURSIVE.
+	Recursive bool
+}
+
+// SetMountAttrAt changes the attributes of the mount pointed to by pop, which
+// must be the root of a mount, as for mount_setattr(2). The mount must be in
+// the caller's mount namespace or in a detached mount tree. If any mount
+// can't be made read-only, no attributes are changed.
+func (vfs *VirtualFilesystem) SetMountAttrAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation, opts *SetMountAttrOptions) error {
+	vd, err := vfs.GetDentryAt(ctx, creds, pop, &GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+	// See the similar defer in UmountAt for why this is in a closure.
+	defer func() {
+		vd.DecRef(ctx)
+	}()
+	if vd.dentry.isMounted() {
+		if realmnt := vfs.getMountAt(ctx, vd.mount, vd.dentry); realmnt != nil {
+			vd.mount.DecRef(ctx)
+			vd.mount = realmnt
+		}
+	} else if vd.dentry != vd.mount.root {
+		return linuxerr.EINVAL
+	}
+
+	mntns := MountNamespaceFromContext(ctx)
+	if mntns != nil {
+		defer mntns.DecRef(ctx)
+	}
+	vfs.mountMu.Lock()
+	defer vfs.mountMu.Unlock()
+	// Compare Linux's fs/namespace.c:do_mount_setattr().
+	if vd.mount.umounted || vd.mount.ns == nil || (mntns != nil && vd.mount.ns != mntns && !vd.mount.ns.detached) {
+		return linuxerr.EINVAL
+	}
+	mounts := []*Mount{vd.mount}
+	if opts.Recursive {
+		mounts = vd.mount.appendDescendantsLocked(mounts)
+	}
+
+	// Changing MOUNT_ATTR_RDONLY is the only change that can fail, so do it
+	// first, and undo it if it fails for any mount.
+	if (opts.Set|opts.Clear)&linux.MOUNT_ATTR_RDONLY != 0 {
+		ro := opts.Set&linux.MOUNT_ATTR_RDONLY != 0
+		var changed []*Mount
+		for _, mnt := range mounts {
+			if mnt.ReadOnly() == ro {
+				continue
+			}
+			if err := mnt.setReadOnlyLocked(ro); err != nil {
+				for _, m := range changed {
+					m.setReadOnlyLocked(!ro)
+				}
+				return err
+			}
+			changed = append(changed, mnt)
+		}
+	}
+	for _, mnt := range mounts {
+		flags := mnt.Flags()
+		applyMountAttr(&flags.NoSUID, linux.MOUNT_ATTR_NOSUID, opts)
+		applyMountAttr(&flags.NoDev, linux.MOUNT_ATTR_NODEV, opts)
+		applyMountAttr(&flags.NoExec, linux.MOUNT_ATTR_NOEXEC, opts)
+		if opts.Clear&linux.MOUNT_ATTR__ATIME == linux.MOUNT_ATTR__ATIME {
+			flags.NoATime = opts.Set&linux.MOUNT_ATTR__ATIME == linux.MOUNT_ATTR_NOATIME
+		}
+		mnt.flags.Store(flags.bits())
+	}
+	if opts.Propagation == Unknown {
+		return nil
+	}
+	for _, mnt := range mounts {
+		if opts.Propagation == mnt.propType {
+			continue
+		}
+		if err := vfs.setPropagation(mnt, opts.Propagation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMountAttr sets or clears *flag as requested for attr by opts.
+func applyMountAttr(flag *bool, attr uint64, opts *SetMountAttrOptions) {
+	if opts.Clear&attr != 0 {
+		*flag = false
+	}
+	if opts.Set&attr != 0 {
+		*flag = true
+	}
+}
+
+// appendDescendantsLocked appends all mounts below mnt that haven't been
+// unmounted to mounts, and returns the updated slice.
+//
+// +checklocks:mnt.vfs.mountMu
+func (mnt *Mount) appendDescendantsLocked(mounts []*Mount) []*Mount {
+	for child := range mnt.children {
+		if child.umounted {
+			continue
+		}
+		mounts = append(mounts, child)
+		mounts = child.appendDescendantsLocked(mounts)
+	}
+	return mounts
+}
@@ -31,11 +31,18 @@ type opathFD struct {
 	vfsfd FileDescription
 	FileDescriptionDefaultImpl
 	BadLockFD
+
+	// detached is the MountNamespace of the detached mount tree that was
+	// returned by NewDetachedMountFD, or nil if fd was opened normally.
+	// detached is immutable.
+	detached *MountNamespace
 }
 
 // Release implements FileDescriptionImpl.Release.
-func (fd *opathFD) Release(context.Context) {
-	// noop
+func (fd *opathFD) Release(ctx context.Context) {
+	if fd.detached != nil {
+		fd.vfsfd.vd.mount.vfs.dissolveDetachedMountTree(ctx, fd.detached)
+	}
 }
 
 // Allocate implements FileDescriptionImpl.Allocate.
@@ -100,6 +100,43 @@ type MountFlags struct {
 	NoSUID bool
 }
 
+// Bits used to store MountFlags in Mount.flags.
+const (
+	mountFlagNoExec = 1 << iota
+	mountFlagNoATime
+	mountFlagNoDev
+	mountFlagNoSUID
+)
+
+// bits returns f encoded as a bitmask.
+func (f MountFlags) bits() uint32 {
+	var b uint32
+	if f.NoExec {
+		b |= mountFlagNoExec
+	}
+	if f.NoATime {
+		b |= mountFlagNoATime
+	}
+	if f.NoDev {
+		b |= mountFlagNoDev
+	}
+	if f.NoSUID {
+		b |= mountFlagNoSUID
+	}
+	return b
+}
+
+// mountFlagsFromBits returns the MountFlags encoded by b, as returned by
+// MountFlags.bits().
+func mountFlagsFromBits(b uint32) MountFlags {
+	return MountFlags{
+		NoExec:  b&mountFlagNoExec != 0,
+		NoATime: b&mountFlagNoATime != 0,
+		NoDev:   b&mountFlagNoDev != 0,
+		NoSUID:  b&mountFlagNoSUID != 0,
+	}
+}
+
 // MountOptions contains options to VirtualFilesystem.MountAt().
 //
 // +stateify savable
@@ -262,6 +299,9 @@ type StatOptions struct {
 	// Sync specifies the synchronization required, and is one of
 	// linux.AT_STATX_SYNC_AS_STAT (which is 0, and therefore the default),
 	// linux.AT_STATX_SYNC_FORCE_SYNC, or linux.AT_STATX_SYNC_DONT_SYNC.
+	// FilesystemImpls that cache metadata for remote files may return cached
+	// metadata without contacting the remote if Sync is
+	// linux.AT_STATX_DONT_SYNC.
 	Sync uint32
 }
 
@@ -309,6 +309,19 @@ func CheckXattrPermissions(creds *auth.Credentials, ats AccessTypes, mode linux.
 			return linuxerr.EPERM
 		}
 		return linuxerr.ENODATA
+	case name == linux.XATTR_NAME_CAPS:
+		// Setting or removing file capabilities requires CAP_SETFCAP, see
+		// security/commoncap.c:cap_convert_nscap() and
+		// cap_inode_removexattr().
+		if ats.MayWrite() && !creds.HasCapability(linux.CAP_SETFCAP) {
+			return linuxerr.EPERM
+		}
+	case strings.HasPrefix(name, linux.XATTR_SECURITY_PREFIX):
+		// Writing other attributes in the security.* namespace requires
+		// CAP_SYS_ADMIN, see security/commoncap.c:cap_inode_setxattr().
+		if ats.MayWrite() && !creds.HasCapability(linux.CAP_SYS_ADMIN) {
+			return linuxerr.EPERM
+		}
 	case strings.HasPrefix(name, linux.XATTR_USER_PREFIX):
 		// In the user.* namespace, only regular files and directories can have
 		// extended attributes. For sticky directories, only the owner and
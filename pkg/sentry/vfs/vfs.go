@@ -127,6 +127,18 @@ type VirtualFilesystem struct {
 
 	// groupIDBitmap tracks which mount group IDs are available for allocation.
 	groupIDBitmap bitmap.Bitmap
+
+	// fanotifyGroups contains all fanotify groups that have added a mark, and
+	// therefore receive events. fanotifyGroups is protected by
+	// fanotifyGroupsMu. numFanotifyGroups is len(fanotifyGroups), and is
+	// accessed using atomic memory operations so that file operations can
+	// skip fanotify when no groups exist.
+	//
+	// Lock ordering: fanotifyGroupsMu is taken before Fanotify.mu and
+	// Fanotify.evMu.
+	fanotifyGroupsMu  sync.RWMutex `state:"nosave"`
+	fanotifyGroups    map[*Fanotify]struct{}
+	numFanotifyGroups atomicbitops.Int32
 }
 
 // Init initializes a new VirtualFilesystem with no mounts or FilesystemTypes.
@@ -290,6 +302,12 @@ func (vfs *VirtualFilesystem) LinkAt(ctx context.Context, creds *auth.Credential
 		ctx.Warningf("VirtualFilesystem.LinkAt: file creation paths can't follow final symlink")
 		return linuxerr.EINVAL
 	}
+	if creds.LandlockDomain != nil {
+		if err := vfs.checkLandlockLink(ctx, creds, oldVD, oldpop, newpop); err != nil {
+			oldVD.DecRef(ctx)
+			return err
+		}
+	}
 
 	rp := vfs.getResolvingPath(creds, newpop)
 	for {
@@ -329,6 +347,11 @@ func (vfs *VirtualFilesystem) MkdirAt(ctx context.Context, creds *auth.Credentia
 	// "Under Linux, apart from the permission bits, the S_ISVTX mode bit is
 	// also honored." - mkdir(2)
 	opts.Mode &= 0777 | linux.S_ISVTX
+	if creds.LandlockDomain != nil {
+		if err := vfs.checkLandlockParentAccess(ctx, creds, pop, linux.LANDLOCK_ACCESS_FS_MAKE_DIR); err != nil {
+			return err
+		}
+	}
 
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
@@ -364,6 +387,11 @@ func (vfs *VirtualFilesystem) MknodAt(ctx context.Context, creds *auth.Credentia
 		ctx.Warningf("VirtualFilesystem.MknodAt: file creation paths can't follow final symlink")
 		return linuxerr.EINVAL
 	}
+	if creds.LandlockDomain != nil {
+		if err := vfs.checkLandlockParentAccess(ctx, creds, pop, landlockMakeAccess(uint16(opts.Mode.FileType()))); err != nil {
+			return err
+		}
+	}
 
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
@@ -428,6 +456,11 @@ func (vfs *VirtualFilesystem) OpenAt(ctx context.Context, creds *auth.Credential
 	if opts.Flags&linux.O_PATH != 0 {
 		return vfs.openOPathFD(ctx, creds, pop, opts.Flags)
 	}
+	if creds.LandlockDomain != nil && opts.Flags&linux.O_CREAT != 0 {
+		if err := vfs.checkLandlockCreate(ctx, creds, pop); err != nil {
+			return nil, err
+		}
+	}
 	rp := vfs.getResolvingPath(creds, pop)
 	if opts.Flags&linux.O_DIRECTORY != 0 {
 		rp.mustBeDir = true
@@ -437,8 +470,15 @@ func (vfs *VirtualFilesystem) OpenAt(ctx context.Context, creds *auth.Credential
 		if err == nil {
 			rp.Release(ctx)
 
+			if creds.LandlockDomain != nil {
+				if err := vfs.checkLandlockOpen(ctx, creds, fd, opts); err != nil {
+					fd.DecRef(ctx)
+					return nil, err
+				}
+			}
+
 			if opts.FileExec {
-				if fd.Mount().Flags.NoExec {
+				if fd.Mount().Flags().NoExec {
 					fd.DecRef(ctx)
 					return nil, linuxerr.EACCES
 				}
@@ -456,6 +496,7 @@ func (vfs *VirtualFilesystem) OpenAt(ctx context.Context, creds *auth.Credential
 			}
 
 			fd.Dentry().InotifyWithParent(ctx, linux.IN_OPEN, 0, PathEvent)
+			fd.notifyFanotify(ctx, linux.FAN_OPEN)
 			return fd, nil
 		}
 		if !rp.handleError(ctx, err) {
@@ -519,6 +560,12 @@ func (vfs *VirtualFilesystem) RenameAt(ctx context.Context, creds *auth.Credenti
 		ctx.Warningf("VirtualFilesystem.RenameAt: destination path can't follow final symlink")
 		return linuxerr.EINVAL
 	}
+	if creds.LandlockDomain != nil {
+		if err := vfs.checkLandlockRename(ctx, creds, oldParentVD, oldpop, newpop); err != nil {
+			oldParentVD.DecRef(ctx)
+			return err
+		}
+	}
 
 	rp := vfs.getResolvingPath(creds, newpop)
 	renameOpts := *opts
@@ -559,6 +606,11 @@ func (vfs *VirtualFilesystem) RmdirAt(ctx context.Context, creds *auth.Credentia
 		ctx.Warningf("VirtualFilesystem.RmdirAt: file deletion paths can't follow final symlink")
 		return linuxerr.EINVAL
 	}
+	if creds.LandlockDomain != nil {
+		if err := vfs.checkLandlockParentAccess(ctx, creds, pop, linux.LANDLOCK_ACCESS_FS_REMOVE_DIR); err != nil {
+			return err
+		}
+	}
 
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
@@ -642,6 +694,11 @@ func (vfs *VirtualFilesystem) SymlinkAt(ctx context.Context, creds *auth.Credent
 		ctx.Warningf("VirtualFilesystem.SymlinkAt: file creation paths can't follow final symlink")
 		return linuxerr.EINVAL
 	}
+	if creds.LandlockDomain != nil {
+		if err := vfs.checkLandlockParentAccess(ctx, creds, pop, linux.LANDLOCK_ACCESS_FS_MAKE_SYM); err != nil {
+			return err
+		}
+	}
 
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
@@ -676,6 +733,11 @@ func (vfs *VirtualFilesystem) UnlinkAt(ctx context.Context, creds *auth.Credenti
 		ctx.Warningf("VirtualFilesystem.UnlinkAt: file deletion paths can't follow final symlink")
 		return linuxerr.EINVAL
 	}
+	if creds.LandlockDomain != nil {
+		if err := vfs.checkLandlockParentAccess(ctx, creds, pop, linux.LANDLOCK_ACCESS_FS_REMOVE_FILE); err != nil {
+			return err
+		}
+	}
 
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
@@ -0,0 +1,183 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watchdog
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// bundleTimeout is the maximum amount of time spent collecting a diagnostic
+// bundle. Sections that are not collected in time, e.g. because they depend
+// on locks held by stuck tasks, are left out of the bundle.
+var bundleTimeout = 30 * time.Second
+
+// BundleSection is a file in a diagnostic bundle.
+type BundleSection struct {
+	// Name is the name of the file in the bundle.
+	Name string
+
+	// Write writes the content of the file to w.
+	Write func(w io.Writer) error
+}
+
+// bundleResult is the result of collecting a BundleSection.
+type bundleResult struct {
+	data []byte
+	err  error
+}
+
+// writeBundle writes a diagnostic bundle, a tarball with one file per
+// section, to w.BundleFile. msg is the reason why the bundle is written.
+func (w *Watchdog) writeBundle(msg string) {
+	if w.BundleFile == nil {
+		log.Warningf("Watchdog: no bundle file configured, skipping diagnostic bundle")
+		return
+	}
+	log.Warningf("Watchdog: writing diagnostic bundle")
+
+	sections := append([]BundleSection{
+		{Name: "report.txt", Write: func(out io.Writer) error {
+			_, err := io.WriteString(out, msg)
+			return err
+		}},
+		{Name: "goroutines.txt", Write: writeProfile("goroutine", 2)},
+		{Name: "goroutine_labels.txt", Write: writeProfile("goroutine", 1)},
+		{Name: "heap.pprof", Write: writeProfile("heap", 0)},
+		{Name: "tasks.txt", Write: w.writeTasks},
+	}, w.BundleSections...)
+
+	// Collect all sections concurrently, so that a stuck section doesn't
+	// prevent others from being collected.
+	results := make([]chan bundleResult, len(sections))
+	for i, s := range sections {
+		results[i] = make(chan bundleResult, 1)
+		go func(s BundleSection, res chan<- bundleResult) { // S/R-SAFE: watchdog is stopped during save and restarted after restore.
+			var buf bytes.Buffer
+			err := s.Write(&buf)
+			res <- bundleResult{data: buf.Bytes(), err: err}
+		}(s, results[i])
+	}
+
+	var errs bytes.Buffer
+	tw := tar.NewWriter(w.BundleFile)
+	now := time.Now()
+	deadline := time.After(bundleTimeout)
+	timedOut := false
+	for i, s := range sections {
+		var res bundleResult
+		if timedOut {
+			fmt.Fprintf(&errs, "%s: timed out\n", s.Name)
+			continue
+		}
+		select {
+		case res = <-results[i]:
+		case <-deadline:
+			timedOut = true
+			fmt.Fprintf(&errs, "%s: timed out\n", s.Name)
+			continue
+		}
+		if res.err != nil {
+			fmt.Fprintf(&errs, "%s: %v\n", s.Name, res.err)
+		}
+		if err := writeTarFile(tw, s.Name, res.data, now); err != nil {
+			log.Warningf("Watchdog: writing diagnostic bundle: %v", err)
+			return
+		}
+	}
+	if errs.Len() > 0 {
+		if err := writeTarFile(tw, "errors.txt", errs.Bytes(), now); err != nil {
+			log.Warningf("Watchdog: writing diagnostic bundle: %v", err)
+			return
+		}
+	}
+	if err := tw.Close(); err != nil {
+		log.Warningf("Watchdog: writing diagnostic bundle: %v", err)
+		return
+	}
+	log.Warningf("Watchdog: diagnostic bundle written")
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writeProfile returns a function that writes the named pprof profile.
+func writeProfile(name string, debug int) func(io.Writer) error {
+	return func(out io.Writer) error {
+		p := pprof.Lookup(name)
+		if p == nil {
+			return fmt.Errorf("profile %q not found", name)
+		}
+		return p.WriteTo(out, debug)
+	}
+}
+
+// writeTasks writes the state of all tasks. Tasks don't have kernel wait
+// channels, so the goroutine ID is included instead, which identifies the
+// task's stack in goroutines.txt.
+func (w *Watchdog) writeTasks(out io.Writer) error {
+	ts := w.k.TaskSet()
+	fmt.Fprintf(out, "%-8s %-8s %-16s %-6s %-16s %s\n", "TID", "TGID", "NAME", "STATE", "GOROUTINE_STATE", "GOROUTINE")
+	for _, t := range ts.Root.Tasks() {
+		_, err := fmt.Fprintf(out, "%-8d %-8d %-16s %-6s %-16s %d\n",
+			ts.Root.IDOfTask(t),
+			ts.Root.IDOfThreadGroup(t.ThreadGroup()),
+			t.Name(),
+			t.StateStatus(),
+			goroutineStateString(t.TaskGoroutineSchedInfo().State),
+			t.GoroutineID())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func goroutineStateString(s kernel.TaskGoroutineState) string {
+	switch s {
+	case kernel.TaskGoroutineNonexistent:
+		return "nonexistent"
+	case kernel.TaskGoroutineRunningSys:
+		return "running-sys"
+	case kernel.TaskGoroutineRunningApp:
+		return "running-app"
+	case kernel.TaskGoroutineBlockedInterruptible:
+		return "blocked"
+	case kernel.TaskGoroutineBlockedUninterruptible:
+		return "blocked-unint"
+	case kernel.TaskGoroutineStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+}
@@ -26,11 +26,15 @@
 //     If a tasks continues to be stuck, the message will repeat every minute, unless
 //     a new stuck task is detected
 //  2. Panic: same as above, followed by panic()
+//
+// Either action can be preceded by writing a diagnostic bundle, see Bundle.
 package watchdog
 
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -58,6 +62,13 @@ type Opts struct {
 	// StartupTimeoutAction indicates what action to take when
 	// watchdog.Start is not called within the timeout.
 	StartupTimeoutAction Action
+
+	// BundleFile is where the diagnostic bundle is written if an action
+	// includes Bundle. If it is nil, no bundle is written.
+	BundleFile io.Writer
+
+	// BundleSections are additional files added to the diagnostic bundle.
+	BundleSections []BundleSection
 }
 
 // DefaultOpts is a default set of options for the watchdog.
@@ -90,13 +101,28 @@ const (
 	Panic
 )
 
-// Set implements flag.Value.
+// Bundle may be combined with LogWarning or Panic, in which case a diagnostic
+// bundle is written to Opts.BundleFile before taking the action. Only one
+// bundle is written during the lifetime of the watchdog.
+const Bundle Action = 1 << 8
+
+// Set implements flag.Value. Actions are "log" or "panic", optionally preceded
+// by "bundle," (e.g. "bundle,panic"). "bundle" on its own is equivalent to
+// "bundle,log".
 func (a *Action) Set(v string) error {
+	var bundle Action
+	if v == "bundle" {
+		v = "log"
+		bundle = Bundle
+	} else if strings.HasPrefix(v, "bundle,") {
+		v = strings.TrimPrefix(v, "bundle,")
+		bundle = Bundle
+	}
 	switch v {
 	case "log", "logwarning":
-		*a = LogWarning
+		*a = LogWarning | bundle
 	case "panic":
-		*a = Panic
+		*a = Panic | bundle
 	default:
 		return fmt.Errorf("invalid watchdog action %q", v)
 	}
@@ -115,6 +141,10 @@ func (a Action) String() string {
 		return "logWarning"
 	case Panic:
 		return "panic"
+	case Bundle | LogWarning:
+		return "bundle,log"
+	case Bundle | Panic:
+		return "bundle,panic"
 	default:
 		panic(fmt.Sprintf("Invalid watchdog action: %d", a))
 	}
@@ -158,6 +188,9 @@ type Watchdog struct {
 	// startCalled is true if Start has ever been called. It remains true
 	// even if Stop is called.
 	startCalled bool
+
+	// bundleOnce ensures that only one diagnostic bundle is written.
+	bundleOnce sync.Once
 }
 
 type offender struct {
@@ -348,6 +381,10 @@ func (w *Watchdog) reportStuckWatchdog() {
 // is not always dumped to the log to prevent log flooding. "forceStack"
 // guarantees that the stack will be dumped regardless.
 func (w *Watchdog) doAction(action Action, forceStack bool, msg *bytes.Buffer) {
+	if action&Bundle != 0 {
+		w.bundleOnce.Do(func() { w.writeBundle(msg.String()) })
+		action &^= Bundle
+	}
 	switch action {
 	case LogWarning:
 		// Dump stack only if forced or sometime has passed since the last time a
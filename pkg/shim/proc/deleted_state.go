@@ -22,7 +22,7 @@ import (
 	"github.com/containerd/console"
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/pkg/process"
-	runc "github.com/containerd/go-runc"
+	"gvisor.dev/gvisor/pkg/shim/runsc"
 )
 
 type deletedState struct{}
@@ -54,6 +54,6 @@ func (s *deletedState) State(context.Context) (string, error) {
 	return "stopped", nil
 }
 
-func (s *deletedState) Stats(context.Context, string) (*runc.Stats, error) {
+func (s *deletedState) Stats(context.Context, string) (*runsc.Stats, error) {
 	return nil, fmt.Errorf("cannot stat a stopped container/process")
 }
@@ -28,7 +28,6 @@ import (
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/log"
 	"github.com/containerd/containerd/pkg/stdio"
-	"github.com/containerd/fifo"
 	runc "github.com/containerd/go-runc"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -224,7 +223,7 @@ func (e *execProcess) start(ctx context.Context) error {
 		return e.parent.runtimeError(err, "OCI runtime exec failed")
 	}
 	if e.stdio.Stdin != "" {
-		sc, err := fifo.OpenFifo(context.Background(), e.stdio.Stdin, unix.O_WRONLY|unix.O_NONBLOCK, 0)
+		sc, err := openFifo(context.Background(), e.stdio.Stdin)
 		if err != nil {
 			return fmt.Errorf("failed to open stdin fifo %s: %w", e.stdio.Stdin, err)
 		}
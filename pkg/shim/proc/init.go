@@ -31,7 +31,6 @@ import (
 	"github.com/containerd/containerd/mount"
 	"github.com/containerd/containerd/pkg/process"
 	"github.com/containerd/containerd/pkg/stdio"
-	"github.com/containerd/fifo"
 	runc "github.com/containerd/go-runc"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -139,7 +138,7 @@ func (p *Init) Create(ctx context.Context, r *CreateConfig) (err error) {
 		return p.runtimeError(err, "OCI runtime create failed")
 	}
 	if r.Stdin != "" {
-		sc, err := fifo.OpenFifo(context.Background(), r.Stdin, unix.O_WRONLY|unix.O_NONBLOCK, 0)
+		sc, err := openFifo(context.Background(), r.Stdin)
 		if err != nil {
 			return fmt.Errorf("failed to open stdin fifo %s: %w", r.Stdin, err)
 		}
@@ -317,17 +316,24 @@ func (p *Init) Resize(ws console.WinSize) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.console == nil {
-		return nil
-	}
-	return p.console.Resize(ws)
+	return p.resize(ws)
 }
 
 func (p *Init) resize(ws console.WinSize) error {
 	if p.console == nil {
 		return nil
 	}
-	return p.console.Resize(ws)
+	if err := p.console.Resize(ws); err != nil {
+		return err
+	}
+	if p.Sandbox {
+		// The sandbox process has the console as its controlling terminal,
+		// so it is notified of the resize and forwards SIGWINCH itself.
+		return nil
+	}
+	// No host process has a subcontainer's console as its controlling
+	// terminal, so the sandbox must be told about the resize explicitly.
+	return p.runtime.ResizeTTY(context.Background(), p.id, 0, ws.Height, ws.Width)
 }
 
 // Kill kills the init process.
@@ -422,14 +428,14 @@ func (p *Init) exec(path string, r *ExecConfig) (process.Process, error) {
 	return e, nil
 }
 
-func (p *Init) Stats(ctx context.Context, id string) (*runc.Stats, error) {
+func (p *Init) Stats(ctx context.Context, id string) (*runsc.Stats, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	return p.initState.Stats(ctx, id)
 }
 
-func (p *Init) stats(ctx context.Context, id string) (*runc.Stats, error) {
+func (p *Init) stats(ctx context.Context, id string) (*runsc.Stats, error) {
 	return p.Runtime().Stats(ctx, id)
 }
 
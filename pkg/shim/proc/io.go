@@ -17,10 +17,12 @@ package proc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/containerd/containerd/log"
 	"github.com/containerd/fifo"
@@ -131,6 +133,34 @@ func copyPipes(ctx context.Context, rio runc.IO, stdin, stdout, stderr string, w
 	return nil
 }
 
+const (
+	// fifoOpenRetries is the number of times that openFifo retries to open
+	// a FIFO that has no reader.
+	fifoOpenRetries = 50
+
+	// fifoOpenRetryInterval is the interval between retries of openFifo.
+	fifoOpenRetryInterval = 100 * time.Millisecond
+)
+
+// openFifo opens the FIFO at path for writing without blocking. While
+// containerd restarts, the reading side of the FIFO may be briefly closed, in
+// which case opening fails with ENXIO; openFifo retries in that case instead
+// of failing the process.
+func openFifo(ctx context.Context, path string) (io.ReadWriteCloser, error) {
+	for i := 0; ; i++ {
+		f, err := fifo.OpenFifo(ctx, path, unix.O_WRONLY|unix.O_NONBLOCK, 0)
+		if err == nil || !errors.Is(err, unix.ENXIO) || i >= fifoOpenRetries {
+			return f, err
+		}
+		log.G(ctx).Debugf("FIFO %q has no reader, retrying open", path)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(fifoOpenRetryInterval):
+		}
+	}
+}
+
 // countingWriteCloser masks io.Closer() until close has been invoked a certain number of times.
 type countingWriteCloser struct {
 	io.WriteCloser
@@ -394,14 +394,56 @@ func (r *Runsc) Kill(context context.Context, id string, sig int, opts *KillOpts
 	return r.runOrError(r.command(context, append(args, id, strconv.Itoa(sig))...))
 }
 
+// ResizeTTY sets the window size of the terminal of the given process in the
+// container. If pid is 0, the terminal of the container init process is
+// resized.
+func (r *Runsc) ResizeTTY(context context.Context, id string, pid int, rows, cols uint16) error {
+	args := []string{"resize-tty"}
+	if pid != 0 {
+		args = append(args, "--pid", strconv.Itoa(pid))
+	}
+	args = append(args, id, strconv.Itoa(int(rows)), strconv.Itoa(int(cols)))
+	return r.runOrError(r.command(context, args...))
+}
+
+// Stats holds the stats reported by "runsc events --stats". It extends
+// runc.Stats with the stats of the sandbox's network interfaces.
+type Stats struct {
+	runc.Stats
+	NetworkInterfaces []*NetworkInterface `json:"network_interfaces,omitempty"`
+}
+
+// NetworkInterface holds the stats of a network interface in the sandbox.
+// Counters are cumulative since the interface was created.
+type NetworkInterface struct {
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
 // Stats return the stats for a container like cpu, memory, and I/O.
-func (r *Runsc) Stats(context context.Context, id string) (*runc.Stats, error) {
+//
+// The stats are collected by the sentry through the sandbox's control server,
+// since host cgroups only account for the overhead of the sandbox processes.
+// runsc still fills in the limits and throttling of the sandbox from the host
+// cgroups.
+func (r *Runsc) Stats(context context.Context, id string) (*Stats, error) {
 	cmd := r.command(context, "events", "--stats", id)
 	data, stderr, err := cmdOutput(cmd, false)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", err, stderr)
 	}
-	var e runc.Event
+	var e struct {
+		Type  string `json:"type"`
+		ID    string `json:"id"`
+		Stats *Stats `json:"data,omitempty"`
+	}
 	if err := json.Unmarshal(data, &e); err != nil {
 		log.L.Debugf("Parsing events error: %v", err)
 		return nil, err
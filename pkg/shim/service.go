@@ -30,6 +30,7 @@ import (
 	"github.com/containerd/cgroups"
 	cgroupsstats "github.com/containerd/cgroups/stats/v1"
 	cgroupsv2 "github.com/containerd/cgroups/v2"
+	cgroupsv2stats "github.com/containerd/cgroups/v2/stats"
 	"github.com/containerd/console"
 	"github.com/containerd/containerd/api/events"
 	"github.com/containerd/containerd/api/types/task"
@@ -861,13 +862,29 @@ func (s *service) stats(ctx context.Context, r *taskAPI.StatsRequest) (*taskAPI.
 		return nil, err
 	}
 
-	// gvisor currently (as of 2020-03-03) only returns the total memory
-	// usage and current PID value[0]. However, we copy the common fields here
-	// so that future updates will propagate correct information.  We're
-	// using the cgroups.Metrics structure so we're returning the same type
-	// as runc.
-	//
-	// [0]: https://github.com/google/gvisor/blob/277a0d5a1fbe8272d4729c01ee4c6e374d047ebc/runsc/boot/events.go#L61-L81
+	// Report the same metrics types as runc, which depend on the cgroup
+	// version used by the host.
+	var metrics interface{}
+	if cgroups.Mode() == cgroups.Unified {
+		metrics = toMetricsV2(stats)
+	} else {
+		metrics = toMetricsV1(stats)
+	}
+	data, err := typeurl.MarshalAny(metrics)
+	if err != nil {
+		log.L.Debugf("Stats error, id: %s: %v", r.ID, err)
+		return nil, err
+	}
+	log.L.Debugf("Stats success, id: %s: %+v", r.ID, data)
+	return &taskAPI.StatsResponse{
+		Stats: data,
+	}, nil
+}
+
+// toMetricsV1 converts stats into the metrics reported for cgroup v1 hosts.
+// The sentry only accounts for memory usage, pids and network; the remaining
+// fields are taken by runsc from the sandbox's host cgroup, if any.
+func toMetricsV1(stats *runsc.Stats) *cgroupsstats.Metrics {
 	metrics := &cgroupsstats.Metrics{
 		CPU: &cgroupsstats.CPUStat{
 			Usage: &cgroupsstats.CPUUsage{
@@ -914,15 +931,64 @@ func (s *service) stats(ctx context.Context, r *taskAPI.StatsRequest) (*taskAPI.
 			Limit:   stats.Pids.Limit,
 		},
 	}
-	data, err := typeurl.MarshalAny(metrics)
-	if err != nil {
-		log.L.Debugf("Stats error, id: %s: %v", r.ID, err)
-		return nil, err
+	for _, iface := range stats.NetworkInterfaces {
+		metrics.Network = append(metrics.Network, &cgroupsstats.NetworkStat{
+			Name:      iface.Name,
+			RxBytes:   iface.RxBytes,
+			RxPackets: iface.RxPackets,
+			RxErrors:  iface.RxErrors,
+			RxDropped: iface.RxDropped,
+			TxBytes:   iface.TxBytes,
+			TxPackets: iface.TxPackets,
+			TxErrors:  iface.TxErrors,
+			TxDropped: iface.TxDropped,
+		})
+	}
+	return metrics
+}
+
+// toMetricsV2 converts stats into the metrics reported for cgroup v2 hosts.
+// Note that cgroup v2 metrics have no network stats.
+func toMetricsV2(stats *runsc.Stats) *cgroupsv2stats.Metrics {
+	raw := stats.Memory.Raw
+	return &cgroupsv2stats.Metrics{
+		CPU: &cgroupsv2stats.CPUStat{
+			UsageUsec:     stats.Cpu.Usage.Total / 1000,
+			UserUsec:      stats.Cpu.Usage.User / 1000,
+			SystemUsec:    stats.Cpu.Usage.Kernel / 1000,
+			NrPeriods:     stats.Cpu.Throttling.Periods,
+			NrThrottled:   stats.Cpu.Throttling.ThrottledPeriods,
+			ThrottledUsec: stats.Cpu.Throttling.ThrottledTime / 1000,
+		},
+		// Only totals are accounted by the sentry. The breakdown comes
+		// from the memory.stat file of the sandbox's host cgroup, as
+		// reported by runsc.
+		Memory: &cgroupsv2stats.MemoryStat{
+			Anon:         raw["anon"],
+			File:         raw["file"],
+			KernelStack:  raw["kernel_stack"],
+			Slab:         raw["slab"],
+			Sock:         raw["sock"],
+			Shmem:        raw["shmem"],
+			FileMapped:   raw["file_mapped"],
+			FileDirty:    raw["file_dirty"],
+			InactiveAnon: raw["inactive_anon"],
+			ActiveAnon:   raw["active_anon"],
+			InactiveFile: raw["inactive_file"],
+			ActiveFile:   raw["active_file"],
+			Unevictable:  raw["unevictable"],
+			Pgfault:      raw["pgfault"],
+			Pgmajfault:   raw["pgmajfault"],
+			Usage:        stats.Memory.Usage.Usage,
+			UsageLimit:   stats.Memory.Usage.Limit,
+			SwapUsage:    stats.Memory.Swap.Usage,
+			SwapLimit:    stats.Memory.Swap.Limit,
+		},
+		Pids: &cgroupsv2stats.PidsStat{
+			Current: stats.Pids.Current,
+			Limit:   stats.Pids.Limit,
+		},
 	}
-	log.L.Debugf("Stats success, id: %s: %+v", r.ID, data)
-	return &taskAPI.StatsResponse{
-		Stats: data,
-	}, nil
 }
 
 // Update updates a running container.
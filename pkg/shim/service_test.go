@@ -17,7 +17,9 @@ package shim
 import (
 	"testing"
 
+	runc "github.com/containerd/go-runc"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/shim/runsc"
 	"gvisor.dev/gvisor/pkg/shim/utils"
 )
 
@@ -119,3 +121,53 @@ func TestCgroupNoUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	stats := &runsc.Stats{
+		Stats: runc.Stats{
+			Cpu: runc.Cpu{
+				Usage: runc.CpuUsage{Total: 3000, User: 2000, Kernel: 1000},
+			},
+			Memory: runc.Memory{
+				Usage: runc.MemoryEntry{Usage: 4096, Limit: 8192},
+				Raw:   map[string]uint64{"anon": 1024, "file": 2048},
+			},
+			Pids: runc.Pids{Current: 3, Limit: 10},
+		},
+		NetworkInterfaces: []*runsc.NetworkInterface{
+			{Name: "eth0", RxBytes: 10, TxBytes: 20},
+			{Name: "lo", RxPackets: 1, TxPackets: 1},
+		},
+	}
+
+	v1 := toMetricsV1(stats)
+	if got, want := v1.Memory.Usage.Usage, uint64(4096); got != want {
+		t.Errorf("v1 memory usage: got %d, want %d", got, want)
+	}
+	if got, want := v1.Pids.Current, uint64(3); got != want {
+		t.Errorf("v1 pids: got %d, want %d", got, want)
+	}
+	if len(v1.Network) != 2 {
+		t.Fatalf("v1 network: got %d interfaces, want 2", len(v1.Network))
+	}
+	if n := v1.Network[0]; n.Name != "eth0" || n.RxBytes != 10 || n.TxBytes != 20 {
+		t.Errorf("v1 network: got %+v, want eth0 with 10 rx and 20 tx bytes", n)
+	}
+
+	v2 := toMetricsV2(stats)
+	if got, want := v2.CPU.UsageUsec, uint64(3); got != want {
+		t.Errorf("v2 cpu usage: got %d, want %d", got, want)
+	}
+	if got, want := v2.Memory.Usage, uint64(4096); got != want {
+		t.Errorf("v2 memory usage: got %d, want %d", got, want)
+	}
+	if got, want := v2.Memory.UsageLimit, uint64(8192); got != want {
+		t.Errorf("v2 memory limit: got %d, want %d", got, want)
+	}
+	if got, want := v2.Memory.Anon, uint64(1024); got != want {
+		t.Errorf("v2 anon memory: got %d, want %d", got, want)
+	}
+	if got, want := v2.Pids.Limit, uint64(10); got != want {
+		t.Errorf("v2 pids limit: got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statefile
+
+import (
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/compressio"
+	"gvisor.dev/gvisor/pkg/state/wire"
+)
+
+// EncryptionKeySize is the size of keys passed to NewEncryptedWriter and
+// NewEncryptedReader.
+const EncryptionKeySize = 32
+
+const (
+	// encryptionMetadata is the metadata key recording the encryption
+	// algorithm of an encrypted statefile.
+	encryptionMetadata = "_encryption"
+
+	// saltMetadata is the metadata key recording the hex-encoded salt from
+	// which the keys of an encrypted statefile are derived.
+	saltMetadata = "_encryption_salt"
+
+	// encryptionAlgorithm is the only supported value of encryptionMetadata.
+	encryptionAlgorithm = "aes-256-gcm"
+
+	// saltSize is the size of the random salt of each encrypted statefile.
+	saltSize = 32
+
+	// encryptionChunkSize is the maximum amount of data sealed in a chunk.
+	encryptionChunkSize = 1024 * 1024
+
+	// chunkHeaderSize is the size of the length that precedes each sealed
+	// chunk.
+	chunkHeaderSize = 4
+
+	// lastChunk is set in the length of the last chunk.
+	lastChunk = 1 << 31
+)
+
+// ErrEncrypted is returned by NewReader if the statefile is encrypted.
+var ErrEncrypted = errors.New("statefile is encrypted, an encryption key is required")
+
+// ErrInvalidKeySize is returned if an encryption key is not EncryptionKeySize
+// bytes long.
+var ErrInvalidKeySize = fmt.Errorf("encryption key must be %d bytes long", EncryptionKeySize)
+
+// ErrAuthenticationFailed is returned if an encrypted statefile couldn't be
+// authenticated, because the key is wrong or the file has been corrupted.
+var ErrAuthenticationFailed = errors.New("statefile authentication failed: wrong encryption key or corrupted statefile")
+
+// IsEncrypted returns true if metadata was read from an encrypted statefile.
+func IsEncrypted(metadata map[string]string) bool {
+	_, ok := metadata[encryptionMetadata]
+	return ok
+}
+
+// deriveKey derives a key for the given purpose from key and salt.
+func deriveKey(key, salt []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte("gVisor statefile " + purpose))
+	h.Write([]byte{0})
+	h.Write(salt)
+	return h.Sum(nil)
+}
+
+// newAEAD returns the AEAD used to seal chunks with a key derived from key
+// and salt, and the key used for the header HMAC.
+func newAEAD(key, salt []byte) (cipher.AEAD, []byte, error) {
+	block, err := aes.NewCipher(deriveKey(key, salt, "encryption"))
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, deriveKey(key, salt, "integrity"), nil
+}
+
+// NewEncryptedWriter is like NewWriter, but the state data is encrypted and
+// authenticated with AES-256-GCM using key, which must be EncryptionKeySize
+// bytes long.
+//
+// Note that the returned WriteCloser must be closed.
+func NewEncryptedWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, ErrInvalidKeySize
+	}
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	if err := checkMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	// Every statefile uses distinct keys, so that nonces can simply count
+	// chunks.
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, macKey, err := newAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata[encryptionMetadata] = encryptionAlgorithm
+	metadata[saltMetadata] = hex.EncodeToString(salt)
+	defer delete(metadata, encryptionMetadata)
+	defer delete(metadata, saltMetadata)
+	sum, err := writeHeader(w, macKey, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// Data is compressed before it is encrypted, since ciphertext can't be
+	// compressed. Chunks are authenticated by the AEAD instead of
+	// compressio.
+	ew := &encryptedWriter{
+		out:  w,
+		aead: aead,
+		ad:   sum,
+		buf:  make([]byte, 0, encryptionChunkSize),
+	}
+	cw, err := compressio.NewWriter(ew, nil, compressionChunkSize, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedWriteCloser{Writer: cw, ew: ew}, nil
+}
+
+// NewEncryptedReader returns a reader for a statefile written by
+// NewEncryptedWriter with key. Statefiles that aren't encrypted are also
+// accepted, and read without any integrity check; the returned bool is true
+// only if the statefile was encrypted.
+//
+// Each chunk of state data is authenticated before it is returned, so data
+// is never returned from a statefile that has been tampered with; instead
+// ErrAuthenticationFailed is returned, including if the statefile has been
+// truncated.
+func NewEncryptedReader(r io.Reader, key []byte) (wire.Reader, map[string]string, bool, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, nil, false, ErrInvalidKeySize
+	}
+	metadata, raw, err := readHeader(r)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !IsEncrypted(metadata) {
+		if _, err := checkHeader(r, raw, nil); err != nil {
+			return nil, nil, false, err
+		}
+		cr, err := compressio.NewReader(r, nil)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		return cr, metadata, false, nil
+	}
+
+	if alg := metadata[encryptionMetadata]; alg != encryptionAlgorithm {
+		return nil, nil, false, fmt.Errorf("unsupported statefile encryption %q", alg)
+	}
+	salt, err := hex.DecodeString(metadata[saltMetadata])
+	if err != nil || len(salt) != saltSize {
+		return nil, nil, false, ErrAuthenticationFailed
+	}
+	aead, macKey, err := newAEAD(key, salt)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	sum, err := checkHeader(r, raw, macKey)
+	if err == compressio.ErrHashMismatch {
+		err = ErrAuthenticationFailed
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	er := &encryptedReader{
+		in:   r,
+		aead: aead,
+		ad:   sum,
+	}
+	cr, err := compressio.NewReader(er, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	// Neither the salt nor the algorithm are of interest to callers.
+	delete(metadata, encryptionMetadata)
+	delete(metadata, saltMetadata)
+	return cr, metadata, true, nil
+}
+
+// chunkNonce returns the nonce of the chunk with the given index.
+func chunkNonce(aead cipher.AEAD, index uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce, index)
+	return nonce
+}
+
+// chunkAdditionalData returns the additional data authenticated with each
+// chunk. It binds chunks to the header HMAC of the statefile, and marks the
+// last chunk so that truncation can be detected.
+func chunkAdditionalData(sum []byte, last bool) []byte {
+	ad := make([]byte, len(sum)+1)
+	copy(ad, sum)
+	if last {
+		ad[len(sum)] = 1
+	}
+	return ad
+}
+
+// encryptedWriter seals data written to it in chunks of encryptionChunkSize
+// bytes.
+//
+// Each sealed chunk is written to out preceded by its 4-byte big endian
+// length, in which lastChunk is set for the last chunk. The last chunk, which
+// may be empty, is written by Close.
+type encryptedWriter struct {
+	out   io.Writer
+	aead  cipher.AEAD
+	ad    []byte
+	buf   []byte
+	index uint64
+}
+
+// Write implements io.Writer.Write.
+func (w *encryptedWriter) Write(p []byte) (int, error) {
+	done := 0
+	for done < len(p) {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p[done:])
+		w.buf = w.buf[:len(w.buf)+n]
+		done += n
+		// Only seal full chunks once there's more data, so that the last
+		// chunk is never empty unless all data is.
+		if len(w.buf) == cap(w.buf) && done < len(p) {
+			if err := w.flush(false /* last */); err != nil {
+				return done, err
+			}
+		}
+	}
+	return done, nil
+}
+
+// flush seals and writes buffered data.
+func (w *encryptedWriter) flush(last bool) error {
+	sealed := make([]byte, chunkHeaderSize, chunkHeaderSize+len(w.buf)+w.aead.Overhead())
+	sealed = w.aead.Seal(sealed, chunkNonce(w.aead, w.index), w.buf, chunkAdditionalData(w.ad, last))
+	hdr := uint32(len(sealed) - chunkHeaderSize)
+	if last {
+		hdr |= lastChunk
+	}
+	binary.BigEndian.PutUint32(sealed, hdr)
+	w.index++
+	w.buf = w.buf[:0]
+	for done := 0; done < len(sealed); {
+		n, err := w.out.Write(sealed[done:])
+		done += n
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close writes the last chunk.
+func (w *encryptedWriter) Close() error {
+	return w.flush(true /* last */)
+}
+
+// encryptedWriteCloser compresses data and writes it to an encryptedWriter.
+type encryptedWriteCloser struct {
+	*compressio.Writer
+	ew *encryptedWriter
+}
+
+// Close implements io.Closer.Close.
+func (w *encryptedWriteCloser) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		return err
+	}
+	return w.ew.Close()
+}
+
+// encryptedReader opens chunks written by encryptedWriter.
+type encryptedReader struct {
+	in    io.Reader
+	aead  cipher.AEAD
+	ad    []byte
+	index uint64
+
+	// buf holds the remaining data of the current chunk.
+	buf []byte
+
+	// sealed is the buffer that chunks are read into.
+	sealed []byte
+
+	// plain is the buffer that chunks are opened into.
+	plain []byte
+
+	// done is true once the last chunk has been read.
+	done bool
+}
+
+// Read implements io.Reader.Read.
+func (r *encryptedReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// next reads and opens the next chunk.
+func (r *encryptedReader) next() error {
+	var hdr [chunkHeaderSize]byte
+	if _, err := io.ReadFull(r.in, hdr[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// The last chunk is missing.
+			return ErrAuthenticationFailed
+		}
+		return err
+	}
+	size := int(binary.BigEndian.Uint32(hdr[:]) &^ lastChunk)
+	last := binary.BigEndian.Uint32(hdr[:])&lastChunk != 0
+	if size < r.aead.Overhead() || size > encryptionChunkSize+r.aead.Overhead() {
+		return ErrAuthenticationFailed
+	}
+	if cap(r.sealed) < size {
+		r.sealed = make([]byte, size)
+	}
+	sealed := r.sealed[:size]
+	if _, err := io.ReadFull(r.in, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrAuthenticationFailed
+		}
+		return err
+	}
+
+	// The last chunk flag is authenticated as additional data.
+	buf, err := r.aead.Open(r.plain[:0], chunkNonce(r.aead, r.index), sealed, chunkAdditionalData(r.ad, last))
+	if err != nil {
+		return ErrAuthenticationFailed
+	}
+	r.index++
+	r.plain = buf
+	r.buf = buf
+	r.done = last
+	return nil
+}
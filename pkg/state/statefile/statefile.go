@@ -41,6 +41,17 @@
 // information relating to the state encoding itself.
 //
 // After the map, the remainder of the file is the state data.
+//
+// The header and metadata are followed by an HMAC-SHA256 of both, and the
+// state data is compressed in chunks, each of which is also authenticated if
+// an integrity key is provided.
+//
+// Encrypted state files have the same layout, but the metadata additionally
+// records the encryption algorithm and a random salt, from which keys for
+// the header HMAC and for encryption are derived. The compressed state data is
+// then split into chunks that are each sealed with AES-256-GCM, so that state
+// files can still be read as a stream while every chunk is authenticated
+// before it is decompressed. See encryption.go.
 package statefile
 
 import (
@@ -51,7 +62,6 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"hash"
 	"io"
 	"strings"
 	"time"
@@ -104,12 +114,34 @@ func NewWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser
 	if metadata == nil {
 		metadata = make(map[string]string)
 	}
+	if err := checkMetadata(metadata); err != nil {
+		return nil, err
+	}
+	if _, err := writeHeader(w, key, metadata); err != nil {
+		return nil, err
+	}
+
+	// Wrap in compression. We always use "best speed" mode here. When using
+	// "best compression" mode, there is usually only a little gain in file
+	// size reduction, which translate to even smaller gain in restore
+	// latency reduction, while inccuring much more CPU usage at save time.
+	return compressio.NewWriter(w, key, compressionChunkSize, flate.BestSpeed)
+}
+
+// checkMetadata returns an error if metadata contains keys that are reserved
+// for internal use.
+func checkMetadata(metadata map[string]string) error {
 	for k := range metadata {
 		if strings.HasPrefix(k, "_") {
-			return nil, ErrMetadataInvalid
+			return ErrMetadataInvalid
 		}
 	}
+	return nil
+}
 
+// writeHeader writes the magic header, metadata and the HMAC of both using
+// key. It returns the HMAC.
+func writeHeader(w io.Writer, key []byte, metadata map[string]string) ([]byte, error) {
 	// Create our HMAC function.
 	h := hmac.New(sha256.New, key)
 	mw := io.MultiWriter(w, h)
@@ -145,24 +177,19 @@ func NewWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser
 	// Write the current hash.
 	cur := h.Sum(nil)
 	for done := 0; done < len(cur); {
-		n, err := mw.Write(cur[done:])
+		n, err := w.Write(cur[done:])
 		done += n
 		if err != nil {
 			return nil, err
 		}
 	}
-
-	// Wrap in compression. We always use "best speed" mode here. When using
-	// "best compression" mode, there is usually only a little gain in file
-	// size reduction, which translate to even smaller gain in restore
-	// latency reduction, while inccuring much more CPU usage at save time.
-	return compressio.NewWriter(w, key, compressionChunkSize, flate.BestSpeed)
+	return cur, nil
 }
 
 // MetadataUnsafe reads out the metadata from a state file without verifying any
 // HMAC. This function shouldn't be called for untrusted input files.
 func MetadataUnsafe(r io.Reader) (map[string]string, error) {
-	return metadata(r, nil)
+	return metadata(r)
 }
 
 func readMetadataLen(r io.Reader) (uint64, error) {
@@ -175,11 +202,7 @@ func readMetadataLen(r io.Reader) (uint64, error) {
 
 // metadata validates the magic header and reads out the metadata from a state
 // data stream.
-func metadata(r io.Reader, h hash.Hash) (map[string]string, error) {
-	if h != nil {
-		r = io.TeeReader(r, h)
-	}
-
+func metadata(r io.Reader) (map[string]string, error) {
 	// Read and validate magic header.
 	b := make([]byte, len(magicHeader))
 	if _, err := r.Read(b); err != nil {
@@ -215,18 +238,6 @@ func metadata(r io.Reader, h hash.Hash) (map[string]string, error) {
 		return nil, err
 	}
 
-	if h != nil {
-		// Check the hash prior to decoding.
-		cur := h.Sum(nil)
-		buf := make([]byte, len(cur))
-		if _, err := io.ReadFull(r, buf); err != nil {
-			return nil, err
-		}
-		if !hmac.Equal(cur, buf) {
-			return nil, compressio.ErrHashMismatch
-		}
-	}
-
 	// Decode the metadata.
 	metadata := make(map[string]string)
 	if err := json.Unmarshal(b, &metadata); err != nil {
@@ -236,14 +247,47 @@ func metadata(r io.Reader, h hash.Hash) (map[string]string, error) {
 	return metadata, nil
 }
 
-// NewReader returns a reader for a statefile.
-func NewReader(r io.Reader, key []byte) (wire.Reader, map[string]string, error) {
-	// Read the metadata with the hash.
+// readHeader reads out the metadata from a state data stream, along with the
+// raw bytes that it was decoded from, which are covered by the header HMAC.
+func readHeader(r io.Reader) (map[string]string, []byte, error) {
+	var raw bytes.Buffer
+	m, err := metadata(io.TeeReader(r, &raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, raw.Bytes(), nil
+}
+
+// checkHeader reads the header HMAC that follows raw and checks it using
+// key. It returns the HMAC.
+func checkHeader(r io.Reader, raw, key []byte) ([]byte, error) {
 	h := hmac.New(sha256.New, key)
-	metadata, err := metadata(r, h)
+	h.Write(raw)
+	cur := h.Sum(nil)
+	buf := make([]byte, len(cur))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(cur, buf) {
+		return nil, compressio.ErrHashMismatch
+	}
+	return cur, nil
+}
+
+// NewReader returns a reader for a statefile. It returns ErrEncrypted if the
+// statefile is encrypted; see NewEncryptedReader.
+func NewReader(r io.Reader, key []byte) (wire.Reader, map[string]string, error) {
+	// Read the metadata and check the hash prior to using it.
+	metadata, raw, err := readHeader(r)
 	if err != nil {
 		return nil, nil, err
 	}
+	if IsEncrypted(metadata) {
+		return nil, nil, ErrEncrypted
+	}
+	if _, err := checkHeader(r, raw, key); err != nil {
+		return nil, nil, err
+	}
 
 	// Wrap in compression.
 	cr, err := compressio.NewReader(r, key)
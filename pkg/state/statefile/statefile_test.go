@@ -163,6 +163,114 @@ func TestStatefile(t *testing.T) {
 	}
 }
 
+func encrypt(t *testing.T, key, data []byte, metadata map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewEncryptedWriter(&buf, key, metadata)
+	if err != nil {
+		t.Fatalf("error creating writer: got %v, expected nil", err)
+	}
+	if _, err := io.Copy(w, bytes.NewBuffer(data)); err != nil {
+		t.Fatalf("error during write: got %v, expected nil", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error during close: got %v, expected nil", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(b, key []byte) ([]byte, map[string]string, bool, error) {
+	r, metadata, encrypted, err := NewEncryptedReader(bytes.NewReader(b), key)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, nil, false, err
+	}
+	return buf.Bytes(), metadata, encrypted, nil
+}
+
+func TestEncryptedStatefile(t *testing.T) {
+	key := make([]byte, EncryptionKeySize)
+	if _, err := io.ReadFull(crand.Reader, key); err != nil {
+		t.Fatalf("can't generate key: got %v, expected nil", err)
+	}
+
+	for _, c := range []testCase{
+		{"empty", nil, nil},
+		{"some", []byte("data"), map[string]string{"foo": "bar"}},
+		{"chunks", make([]byte, 3*encryptionChunkSize+1), nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := encrypt(t, key, c.data, c.metadata)
+			data, metadata, encrypted, err := decrypt(b, key)
+			if err != nil {
+				t.Fatalf("error during read: got %v, expected nil", err)
+			}
+			if !encrypted {
+				t.Errorf("got encrypted = false, expected true")
+			}
+			if !bytes.Equal(c.data, data) {
+				t.Fatalf("data didn't match (%d vs %d bytes)", len(data), len(c.data))
+			}
+			for k, v := range c.metadata {
+				if nv := metadata[k]; nv != v {
+					t.Fatalf("mismatched metadata for %s: got %s, expected %s", k, nv, v)
+				}
+			}
+
+			// An encrypted statefile can't be read without a key.
+			if _, _, err := NewReader(bytes.NewReader(b), nil); err != ErrEncrypted {
+				t.Errorf("got error: %v, expected ErrEncrypted", err)
+			}
+
+			// Change the key and verify that it fails.
+			newKey := append([]byte(nil), key...)
+			newKey[rand.Intn(len(newKey))]++
+			if _, _, _, err := decrypt(b, newKey); err != ErrAuthenticationFailed {
+				t.Errorf("got error: %v, expected ErrAuthenticationFailed on key mismatch", err)
+			}
+
+			// Change the data past the metadata and verify that it fails.
+			corrupt := append([]byte(nil), b...)
+			corrupt[len(b)-1-rand.Intn(32)]++
+			if _, _, _, err := decrypt(corrupt, key); err != ErrAuthenticationFailed {
+				t.Errorf("got error: %v, expected ErrAuthenticationFailed on data corruption", err)
+			}
+
+			// Truncate the data and verify that it fails.
+			if _, _, _, err := decrypt(b[:len(b)-1], key); err != ErrAuthenticationFailed {
+				t.Errorf("got error: %v, expected ErrAuthenticationFailed on truncation", err)
+			}
+		})
+	}
+
+	t.Run("unencrypted", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating writer: got %v, expected nil", err)
+		}
+		if _, err := w.Write([]byte("data")); err != nil {
+			t.Fatalf("error during write: got %v, expected nil", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("error during close: got %v, expected nil", err)
+		}
+		data, _, encrypted, err := decrypt(buf.Bytes(), key)
+		if err != nil {
+			t.Fatalf("error during read: got %v, expected nil", err)
+		}
+		if encrypted {
+			t.Errorf("got encrypted = true, expected false")
+		}
+		if string(data) != "data" {
+			t.Errorf("got data %q, expected %q", data, "data")
+		}
+	})
+}
+
 const benchmarkDataSize = 100 * 1024 * 1024
 
 func benchmark(b *testing.B, size int, write bool, compressible bool) {
@@ -0,0 +1,404 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dhcp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// maxRetransmission is the maximum timeout for replies to a request, from RFC
+// 2131 section 4.1.
+const maxRetransmission = 64 * time.Second
+
+// paramRequestList is the list of options that the client asks servers for.
+var paramRequestList = []byte{
+	byte(optSubnetMask),
+	byte(optRouter),
+	byte(optDNS),
+	byte(optDomainName),
+	byte(optLeaseTime),
+	byte(optRenewalTime),
+	byte(optRebindingTime),
+}
+
+// Lease is a lease on an address granted by a DHCP server.
+type Lease struct {
+	// Address is the leased address, with the prefix length of its subnet.
+	Address tcpip.AddressWithPrefix
+
+	// Config is the network configuration that came with the lease.
+	Config Config
+
+	// Start is when the lease was granted or last extended.
+	Start time.Time
+}
+
+// AcquiredFunc is called by a Client when its lease changes. lost is the
+// previously leased address if it is no longer leased. acquired is the
+// currently leased address, or empty if the client has no lease, and cfg is
+// its configuration.
+type AcquiredFunc func(lost, acquired tcpip.AddressWithPrefix, cfg Config)
+
+// Client is a DHCP client that leases an IPv4 address for a NIC.
+type Client struct {
+	stack        *stack.Stack
+	nicID        tcpip.NICID
+	linkAddr     tcpip.LinkAddress
+	acquiredFunc AcquiredFunc
+
+	// retransmission is the initial timeout for replies to a request. It is
+	// doubled for each retransmission, up to maxRetransmission.
+	retransmission time.Duration
+
+	mu sync.Mutex
+
+	// +checklocks:mu
+	lease Lease
+}
+
+// NewClient returns a client that leases an address for the NIC with the
+// given ID and Ethernet address. acquiredFunc, if not nil, is called whenever
+// the lease changes. The client doesn't add leased addresses to the NIC;
+// acquiredFunc is expected to do so.
+func NewClient(s *stack.Stack, nicID tcpip.NICID, linkAddr tcpip.LinkAddress, retransmission time.Duration, acquiredFunc AcquiredFunc) *Client {
+	return &Client{
+		stack:          s,
+		nicID:          nicID,
+		linkAddr:       linkAddr,
+		acquiredFunc:   acquiredFunc,
+		retransmission: retransmission,
+	}
+}
+
+// Lease returns the client's current lease. Its Address is empty if the
+// client has no lease.
+func (c *Client) Lease() Lease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lease
+}
+
+// setLease sets the client's lease and reports the change to acquiredFunc.
+func (c *Client) setLease(lease Lease) {
+	c.mu.Lock()
+	old := c.lease
+	c.lease = lease
+	c.mu.Unlock()
+
+	var lost tcpip.AddressWithPrefix
+	if old.Address != lease.Address {
+		lost = old.Address
+	}
+	if c.acquiredFunc != nil {
+		c.acquiredFunc(lost, lease.Address, lease.Config)
+	}
+}
+
+// Acquire obtains a new lease from any server, by broadcasting a
+// DHCPDISCOVER and requesting the first address offered, as in the INIT state
+// of RFC 2131 section 4.4. It retransmits requests until it gets a lease, a
+// server refuses the request or ctx is done.
+func (c *Client) Acquire(ctx context.Context) (Lease, error) {
+	// Until an address is leased, requests are sent from the unspecified
+	// address.
+	unspecified := tcpip.ProtocolAddress{
+		Protocol: header.IPv4ProtocolNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   header.IPv4Any,
+			PrefixLen: header.IPv4AddressSize * 8,
+		},
+	}
+	if err := c.stack.AddProtocolAddress(c.nicID, unspecified, stack.AddressProperties{}); err != nil {
+		return Lease{}, fmt.Errorf("adding %s to NIC %d: %s", unspecified.AddressWithPrefix, c.nicID, err)
+	}
+	defer c.stack.RemoveAddress(c.nicID, header.IPv4Any)
+
+	conn, err := c.dial()
+	if err != nil {
+		return Lease{}, err
+	}
+	defer conn.Close()
+
+	xid := c.newXID()
+	discover := c.newRequest(xid, "" /* ciaddr */, options{
+		{optMessageType, []byte{byte(MsgDiscover)}},
+		{optParamReq, paramRequestList},
+	})
+	offer, offerOpts, _, err := c.exchange(ctx, conn, header.IPv4Broadcast, discover, MsgOffer)
+	if err != nil {
+		return Lease{}, fmt.Errorf("waiting for %s: %w", MsgOffer, err)
+	}
+	server, ok := offerOpts.get(optServerID)
+	if !ok || len(server) != header.IPv4AddressSize {
+		return Lease{}, fmt.Errorf("%s has no valid server identifier", MsgOffer)
+	}
+
+	start := time.Now()
+	request := c.newRequest(xid, "" /* ciaddr */, options{
+		{optMessageType, []byte{byte(MsgRequest)}},
+		{optRequestedIP, []byte(offer.yiaddr())},
+		{optServerID, server},
+		{optParamReq, paramRequestList},
+	})
+	ack, ackOpts, typ, err := c.exchange(ctx, conn, header.IPv4Broadcast, request, MsgAck, MsgNak)
+	if err != nil {
+		return Lease{}, fmt.Errorf("waiting for %s: %w", MsgAck, err)
+	}
+	if typ == MsgNak {
+		return Lease{}, fmt.Errorf("server %s refused to lease %s", tcpip.Address(server), offer.yiaddr())
+	}
+	lease, err := newLease(ack, ackOpts, start)
+	if err != nil {
+		return Lease{}, err
+	}
+	c.setLease(lease)
+	return lease, nil
+}
+
+// Run maintains the client's lease until ctx is done. The lease is extended
+// with the server that granted it after its renewal time and with any server
+// after its rebinding time, as in the RENEWING and REBINDING states of RFC
+// 2131 section 4.4. If the lease expires or a server refuses to extend it, the
+// lease is lost and Run acquires a new one.
+func (c *Client) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		lease := c.Lease()
+		if lease.Address.Address == "" {
+			if _, err := c.Acquire(ctx); err != nil {
+				// Don't flood the network if servers refuse requests.
+				sleepUntil(ctx, time.Now().Add(c.retransmission))
+			}
+			continue
+		}
+		if lease.Config.LeaseLength == 0 {
+			// The lease is infinite.
+			<-ctx.Done()
+			return
+		}
+
+		if !sleepUntil(ctx, lease.Start.Add(lease.Config.RenewalTime)) {
+			return
+		}
+		if c.extend(ctx, lease, lease.Config.ServerAddress, lease.Start.Add(lease.Config.RebindingTime)) {
+			continue
+		}
+		if c.extend(ctx, lease, header.IPv4Broadcast, lease.Start.Add(lease.Config.LeaseLength)) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// The lease expired.
+		c.setLease(Lease{})
+	}
+}
+
+// extend tries to extend lease by sending requests to server until deadline.
+// It returns true if the lease was extended or a server refused to extend it,
+// in which case the lease is lost.
+func (c *Client) extend(ctx context.Context, lease Lease, server tcpip.Address, deadline time.Time) bool {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	conn, err := c.dial()
+	if err != nil {
+		sleepUntil(ctx, deadline)
+		return false
+	}
+	defer conn.Close()
+
+	for ctx.Err() == nil {
+		xid := c.newXID()
+		// Requests to extend a lease identify it by ciaddr, and must not
+		// include the server identifier or requested address options. See
+		// RFC 2131 section 4.3.2.
+		request := c.newRequest(xid, lease.Address.Address, options{
+			{optMessageType, []byte{byte(MsgRequest)}},
+			{optParamReq, paramRequestList},
+		})
+		start := time.Now()
+		ack, ackOpts, typ, err := c.exchange(ctx, conn, server, request, MsgAck, MsgNak)
+		if err != nil {
+			// Writing the request failed, e.g. because the server is
+			// unreachable. Try again later.
+			sleepUntil(ctx, time.Now().Add(c.retransmission))
+			continue
+		}
+		if typ == MsgNak {
+			c.setLease(Lease{})
+			return true
+		}
+		newLease, err := newLease(ack, ackOpts, start)
+		if err != nil {
+			continue
+		}
+		c.setLease(newLease)
+		return true
+	}
+	return false
+}
+
+// newLease returns the lease granted by ack.
+func newLease(ack message, opts options, start time.Time) (Lease, error) {
+	cfg, err := decodeConfig(opts)
+	if err != nil {
+		return Lease{}, fmt.Errorf("invalid %s: %w", MsgAck, err)
+	}
+	addr := ack.yiaddr()
+	if addr == header.IPv4Any {
+		return Lease{}, fmt.Errorf("%s has no address", MsgAck)
+	}
+	return Lease{
+		Address: tcpip.AddressWithPrefix{
+			Address:   addr,
+			PrefixLen: cfg.PrefixLen(addr),
+		},
+		Config: cfg,
+		Start:  start,
+	}, nil
+}
+
+// dial returns a UDP socket that sends from and receives on the client port
+// of the client's NIC.
+func (c *Client) dial() (*gonet.UDPConn, error) {
+	var wq waiter.Queue
+	ep, err := c.stack.NewEndpoint(udp.ProtocolNumber, header.IPv4ProtocolNumber, &wq)
+	if err != nil {
+		return nil, fmt.Errorf("creating UDP endpoint: %s", err)
+	}
+	ep.SocketOptions().SetBroadcast(true)
+	if err := ep.SocketOptions().SetBindToDevice(int32(c.nicID)); err != nil {
+		ep.Close()
+		return nil, fmt.Errorf("binding UDP endpoint to NIC %d: %s", c.nicID, err)
+	}
+	if err := ep.Bind(tcpip.FullAddress{NIC: c.nicID, Port: ClientPort}); err != nil {
+		ep.Close()
+		return nil, fmt.Errorf("binding UDP endpoint to port %d: %s", ClientPort, err)
+	}
+	return gonet.NewUDPConn(c.stack, &wq, ep), nil
+}
+
+// newXID returns a random transaction ID.
+func (c *Client) newXID() uint32 {
+	var b [4]byte
+	if _, err := c.stack.SecureRNG().Read(b[:]); err != nil {
+		return uint32(c.stack.Rand().Int63())
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// newRequest returns a message from the client with the given transaction ID,
+// client address and options. If ciaddr is empty, the client can't receive
+// unicast replies yet, so servers are asked to broadcast them.
+func (c *Client) newRequest(xid uint32, ciaddr tcpip.Address, opts options) message {
+	opts = append(opts, option{optClientID, append([]byte{htypeEthernet}, c.linkAddr...)})
+	m := newMessage(xid, c.linkAddr, opts.encodedLen())
+	if ciaddr == "" {
+		m.setBroadcast()
+	} else {
+		m.setCIAddr(ciaddr)
+	}
+	opts.encode(m[msgOptions:])
+	return m
+}
+
+// exchange sends req to the server port of to, and returns the first reply to
+// it, its options and its type, which must be one of want. req is
+// retransmitted with exponential backoff until a reply is received or ctx is
+// done.
+func (c *Client) exchange(ctx context.Context, conn *gonet.UDPConn, to tcpip.Address, req message, want ...MessageType) (message, options, MessageType, error) {
+	// Interrupt reads once ctx is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	dst := &net.UDPAddr{IP: net.IP(to), Port: ServerPort}
+	buf := make([]byte, header.UDPMaximumPacketSize)
+	timeout := c.retransmission
+	for {
+		if _, err := conn.WriteTo(req, dst); err != nil {
+			return nil, nil, 0, fmt.Errorf("sending %d byte request to %s: %w", len(req), dst, err)
+		}
+		deadline := time.Now().Add(timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+		if err := ctx.Err(); err != nil {
+			return nil, nil, 0, err
+		}
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				// The deadline expired.
+				break
+			}
+			reply := message(buf[:n])
+			if !reply.isValid() || reply.op() != opReply || reply.xid() != req.xid() || reply.chaddr() != c.linkAddr {
+				continue
+			}
+			opts, err := reply.options()
+			if err != nil {
+				continue
+			}
+			typ, err := opts.messageType()
+			if err != nil {
+				continue
+			}
+			for _, w := range want {
+				if typ == w {
+					return append(message(nil), reply...), opts, typ, nil
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, nil, 0, err
+		}
+		if timeout *= 2; timeout > maxRetransmission {
+			timeout = maxRetransmission
+		}
+	}
+}
+
+// sleepUntil sleeps until t or until ctx is done. It returns false if ctx is
+// done.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
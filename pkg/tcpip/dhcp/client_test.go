@@ -0,0 +1,341 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dhcp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/pipe"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/testutil"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	clientNICID = 1
+	serverNICID = 1
+
+	clientLinkAddr = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x01")
+	serverLinkAddr = tcpip.LinkAddress("\x02\x00\x00\x00\x00\x02")
+)
+
+var (
+	serverAddr  = testutil.MustParse4("192.168.1.1")
+	clientAddr  = testutil.MustParse4("192.168.1.10")
+	dnsAddr     = testutil.MustParse4("192.168.1.53")
+	subnetMask  = tcpip.AddressMask(testutil.MustParse4("255.255.255.0"))
+	testTimeout = 10 * time.Second
+)
+
+func newStack(t *testing.T, nicID tcpip.NICID, ep stack.LinkEndpoint) *stack.Stack {
+	t.Helper()
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+	})
+	t.Cleanup(s.Close)
+	if err := s.CreateNIC(nicID, ep); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	return s
+}
+
+// testServer is a minimal DHCP server that leases clientAddr.
+type testServer struct {
+	conn  *gonet.UDPConn
+	lease time.Duration
+
+	// nak makes the server refuse requests to extend leases.
+	nak bool
+}
+
+func newTestServer(t *testing.T, s *stack.Stack, lease time.Duration) *testServer {
+	t.Helper()
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          header.IPv4ProtocolNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{Address: serverAddr, PrefixLen: 24},
+	}
+	if err := s.AddProtocolAddress(serverNICID, protocolAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", serverNICID, protocolAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: serverNICID}})
+
+	var wq waiter.Queue
+	ep, err := s.NewEndpoint(udp.ProtocolNumber, header.IPv4ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint: %s", err)
+	}
+	ep.SocketOptions().SetBroadcast(true)
+	if err := ep.Bind(tcpip.FullAddress{Port: ServerPort}); err != nil {
+		t.Fatalf("Bind: %s", err)
+	}
+	srv := &testServer{
+		conn:  gonet.NewUDPConn(s, &wq, ep),
+		lease: lease,
+	}
+	t.Cleanup(func() { srv.conn.Close() })
+	return srv
+}
+
+func (srv *testServer) serve() {
+	buf := make([]byte, header.UDPMaximumPacketSize)
+	for {
+		n, _, err := srv.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := message(buf[:n])
+		if !req.isValid() || req.op() != opRequest {
+			continue
+		}
+		opts, err := req.options()
+		if err != nil {
+			continue
+		}
+		typ, err := opts.messageType()
+		if err != nil {
+			continue
+		}
+		var replyType MessageType
+		switch typ {
+		case MsgDiscover:
+			replyType = MsgOffer
+		case MsgRequest:
+			replyType = MsgAck
+			if srv.nak && tcpip.Address(req[msgCIAddr:msgCIAddr+4]) != header.IPv4Any {
+				replyType = MsgNak
+			}
+		default:
+			continue
+		}
+
+		var leaseTime [4]byte
+		binary.BigEndian.PutUint32(leaseTime[:], uint32(srv.lease/time.Second))
+		replyOpts := options{
+			{optMessageType, []byte{byte(replyType)}},
+			{optServerID, []byte(serverAddr)},
+			{optLeaseTime, leaseTime[:]},
+			{optSubnetMask, []byte(subnetMask)},
+			{optRouter, []byte(serverAddr)},
+			{optDNS, []byte(dnsAddr)},
+			{optDomainName, []byte("example.com")},
+		}
+		reply := newMessage(req.xid(), req.chaddr(), replyOpts.encodedLen())
+		reply[msgOp] = byte(opReply)
+		if replyType != MsgNak {
+			copy(reply[msgYIAddr:], clientAddr)
+		}
+		replyOpts.encode(reply[msgOptions:])
+		dst := &net.UDPAddr{IP: net.IP(header.IPv4Broadcast), Port: ClientPort}
+		if _, err := srv.conn.WriteTo(reply, dst); err != nil {
+			return
+		}
+	}
+}
+
+func newClientAndServer(t *testing.T, lease time.Duration, nak bool, acquiredFunc AcquiredFunc) *Client {
+	t.Helper()
+	clientEP, serverEP := pipe.New(clientLinkAddr, serverLinkAddr, header.IPv4MinimumMTU)
+	clientStack := newStack(t, clientNICID, clientEP)
+	serverStack := newStack(t, serverNICID, serverEP)
+	srv := newTestServer(t, serverStack, lease)
+	srv.nak = nak
+	go srv.serve()
+
+	c := NewClient(clientStack, clientNICID, clientLinkAddr, 100*time.Millisecond, func(lost, acquired tcpip.AddressWithPrefix, cfg Config) {
+		if lost.Address != "" {
+			clientStack.RemoveAddress(clientNICID, lost.Address)
+		}
+		if acquired.Address != "" && clientStack.CheckLocalAddress(clientNICID, header.IPv4ProtocolNumber, acquired.Address) == 0 {
+			protocolAddr := tcpip.ProtocolAddress{
+				Protocol:          header.IPv4ProtocolNumber,
+				AddressWithPrefix: acquired,
+			}
+			if err := clientStack.AddProtocolAddress(clientNICID, protocolAddr, stack.AddressProperties{}); err != nil {
+				t.Errorf("AddProtocolAddress(%d, %+v, {}): %s", clientNICID, protocolAddr, err)
+			}
+			clientStack.SetRouteTable([]tcpip.Route{{Destination: acquired.Subnet(), NIC: clientNICID}})
+		}
+		if acquiredFunc != nil {
+			acquiredFunc(lost, acquired, cfg)
+		}
+	})
+	return c
+}
+
+func TestAcquire(t *testing.T) {
+	c := newClientAndServer(t, time.Hour, false /* nak */, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	lease, err := c.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if want := (tcpip.AddressWithPrefix{Address: clientAddr, PrefixLen: 24}); lease.Address != want {
+		t.Errorf("got lease.Address = %s, want = %s", lease.Address, want)
+	}
+	if lease.Config.ServerAddress != serverAddr {
+		t.Errorf("got lease.Config.ServerAddress = %s, want = %s", lease.Config.ServerAddress, serverAddr)
+	}
+	if len(lease.Config.DNS) != 1 || lease.Config.DNS[0] != dnsAddr {
+		t.Errorf("got lease.Config.DNS = %v, want = [%s]", lease.Config.DNS, dnsAddr)
+	}
+	if lease.Config.DomainName != "example.com" {
+		t.Errorf("got lease.Config.DomainName = %q, want = %q", lease.Config.DomainName, "example.com")
+	}
+	if got, want := lease.Config.RenewalTime, 30*time.Minute; got != want {
+		t.Errorf("got lease.Config.RenewalTime = %s, want = %s", got, want)
+	}
+	if got, want := lease.Config.RebindingTime, 7*time.Hour/8; got != want {
+		t.Errorf("got lease.Config.RebindingTime = %s, want = %s", got, want)
+	}
+	if got := c.Lease(); got.Address != lease.Address {
+		t.Errorf("got c.Lease().Address = %s, want = %s", got.Address, lease.Address)
+	}
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	clientEP, _ := pipe.New(clientLinkAddr, serverLinkAddr, header.IPv4MinimumMTU)
+	s := newStack(t, clientNICID, clientEP)
+	c := NewClient(s, clientNICID, clientLinkAddr, 10*time.Millisecond, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.Acquire(ctx); err == nil {
+		t.Fatalf("Acquire succeeded without a server")
+	}
+	// The unspecified address is only assigned while acquiring a lease.
+	if nicID := s.CheckLocalAddress(clientNICID, header.IPv4ProtocolNumber, header.IPv4Any); nicID != 0 {
+		t.Errorf("%s is still assigned to NIC %d", header.IPv4Any, nicID)
+	}
+}
+
+func TestRunRenewsLease(t *testing.T) {
+	acquired := make(chan tcpip.AddressWithPrefix, 10)
+	c := newClientAndServer(t, 2*time.Second, false /* nak */, func(_, addr tcpip.AddressWithPrefix, _ Config) {
+		acquired <- addr
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	lease, err := c.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	<-acquired
+	go c.Run(ctx)
+
+	select {
+	case addr := <-acquired:
+		if addr != lease.Address {
+			t.Errorf("renewed lease on %s, want %s", addr, lease.Address)
+		}
+	case <-ctx.Done():
+		t.Fatalf("lease wasn't renewed")
+	}
+	if got := c.Lease(); !got.Start.After(lease.Start) {
+		t.Errorf("got renewed lease start %s, want after %s", got.Start, lease.Start)
+	}
+}
+
+func TestRunLosesLeaseOnNak(t *testing.T) {
+	lost := make(chan tcpip.AddressWithPrefix, 10)
+	c := newClientAndServer(t, 2*time.Second, true /* nak */, func(addr, _ tcpip.AddressWithPrefix, _ Config) {
+		if addr.Address != "" {
+			lost <- addr
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	lease, err := c.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	go c.Run(ctx)
+
+	select {
+	case addr := <-lost:
+		if addr != lease.Address {
+			t.Errorf("lost lease on %s, want %s", addr, lease.Address)
+		}
+	case <-ctx.Done():
+		t.Fatalf("lease wasn't lost")
+	}
+}
+
+func TestDecodeConfigDefaults(t *testing.T) {
+	var leaseTime [4]byte
+	binary.BigEndian.PutUint32(leaseTime[:], 800)
+	cfg, err := decodeConfig(options{{optLeaseTime, leaseTime[:]}})
+	if err != nil {
+		t.Fatalf("decodeConfig: %v", err)
+	}
+	if got, want := cfg.RenewalTime, 400*time.Second; got != want {
+		t.Errorf("got cfg.RenewalTime = %s, want = %s", got, want)
+	}
+	if got, want := cfg.RebindingTime, 700*time.Second; got != want {
+		t.Errorf("got cfg.RebindingTime = %s, want = %s", got, want)
+	}
+	if got, want := cfg.PrefixLen(clientAddr), 24; got != want {
+		t.Errorf("got cfg.PrefixLen(%s) = %d, want = %d", clientAddr, got, want)
+	}
+
+	binary.BigEndian.PutUint32(leaseTime[:], infiniteLeaseTime)
+	if cfg, err := decodeConfig(options{{optLeaseTime, leaseTime[:]}}); err != nil || cfg.LeaseLength != 0 {
+		t.Errorf("got decodeConfig(infinite lease) = %+v, %v, want LeaseLength = 0", cfg, err)
+	}
+	if _, err := decodeConfig(nil); err == nil {
+		t.Errorf("decodeConfig succeeded without a lease time")
+	}
+}
+
+func TestOptionsRoundTrip(t *testing.T) {
+	opts := options{
+		{optMessageType, []byte{byte(MsgDiscover)}},
+		{optParamReq, paramRequestList},
+	}
+	m := newMessage(1234, clientLinkAddr, opts.encodedLen())
+	opts.encode(m[msgOptions:])
+	if !m.isValid() {
+		t.Fatalf("encoded message isn't valid")
+	}
+	if got := m.xid(); got != 1234 {
+		t.Errorf("got xid = %d, want = 1234", got)
+	}
+	if got := m.chaddr(); got != clientLinkAddr {
+		t.Errorf("got chaddr = %s, want = %s", got, clientLinkAddr)
+	}
+	got, err := m.options()
+	if err != nil {
+		t.Fatalf("options: %v", err)
+	}
+	if typ, err := got.messageType(); err != nil || typ != MsgDiscover {
+		t.Errorf("got messageType() = %s, %v, want = %s, nil", typ, err, MsgDiscover)
+	}
+	if body, ok := got.get(optParamReq); !ok || string(body) != string(paramRequestList) {
+		t.Errorf("got parameter request list %v, want %v", body, paramRequestList)
+	}
+}
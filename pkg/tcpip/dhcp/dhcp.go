@@ -0,0 +1,397 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dhcp implements a DHCPv4 client, as described in RFC 2131, that
+// leases addresses for the NICs of a netstack stack.
+package dhcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+const (
+	// ServerPort is the well-known UDP port of DHCP servers.
+	ServerPort = 67
+
+	// ClientPort is the well-known UDP port of DHCP clients.
+	ClientPort = 68
+)
+
+// magicCookie identifies DHCP options, as opposed to BOOTP vendor extensions.
+// See RFC 2131 section 3.
+var magicCookie = [4]byte{99, 130, 83, 99}
+
+// Message operation codes, from RFC 2131 section 2.
+type op byte
+
+const (
+	opRequest op = 1
+	opReply   op = 2
+)
+
+// MessageType is the type of a DHCP message, from RFC 2132 section 9.6.
+type MessageType byte
+
+// DHCP message types.
+const (
+	MsgDiscover MessageType = 1
+	MsgOffer    MessageType = 2
+	MsgRequest  MessageType = 3
+	MsgDecline  MessageType = 4
+	MsgAck      MessageType = 5
+	MsgNak      MessageType = 6
+	MsgRelease  MessageType = 7
+)
+
+// String implements fmt.Stringer.String.
+func (t MessageType) String() string {
+	switch t {
+	case MsgDiscover:
+		return "DHCPDISCOVER"
+	case MsgOffer:
+		return "DHCPOFFER"
+	case MsgRequest:
+		return "DHCPREQUEST"
+	case MsgDecline:
+		return "DHCPDECLINE"
+	case MsgAck:
+		return "DHCPACK"
+	case MsgNak:
+		return "DHCPNAK"
+	case MsgRelease:
+		return "DHCPRELEASE"
+	default:
+		return fmt.Sprintf("MessageType(%d)", t)
+	}
+}
+
+// optionCode is the code of a DHCP option, from RFC 2132.
+type optionCode byte
+
+const (
+	optPad           optionCode = 0
+	optSubnetMask    optionCode = 1
+	optRouter        optionCode = 3
+	optDNS           optionCode = 6
+	optDomainName    optionCode = 15
+	optRequestedIP   optionCode = 50
+	optLeaseTime     optionCode = 51
+	optMessageType   optionCode = 53
+	optServerID      optionCode = 54
+	optParamReq      optionCode = 55
+	optRenewalTime   optionCode = 58
+	optRebindingTime optionCode = 59
+	optClientID      optionCode = 61
+	optEnd           optionCode = 255
+)
+
+// infiniteLeaseTime is the value of the lease time option for leases that
+// never expire.
+const infiniteLeaseTime = 0xffffffff
+
+const (
+	// htypeEthernet is the hardware type of Ethernet, from RFC 1700.
+	htypeEthernet = 1
+
+	// hardwareAddrLength is the length of Ethernet addresses.
+	hardwareAddrLength = 6
+
+	// flagBroadcast asks servers to broadcast replies, for clients that
+	// can't receive unicast packets until they are configured.
+	flagBroadcast = 0x8000
+)
+
+// Offsets of the fields of a DHCP message, from RFC 2131 section 2.
+const (
+	msgOp        = 0
+	msgHType     = 1
+	msgHLen      = 2
+	msgXID       = 4
+	msgFlags     = 10
+	msgCIAddr    = 12
+	msgYIAddr    = 16
+	msgCHAddr    = 28
+	msgCookie    = 236
+	msgOptions   = 240
+	chaddrLength = 16
+)
+
+// message is a DHCP message, consisting of the fixed-format fields followed by
+// options.
+type message []byte
+
+// newMessage returns a message from a client with the given transaction ID
+// and hardware address, and space for options of the given length.
+func newMessage(xid uint32, chaddr tcpip.LinkAddress, optionsLen int) message {
+	m := make(message, msgOptions+optionsLen)
+	m[msgOp] = byte(opRequest)
+	m[msgHType] = htypeEthernet
+	m[msgHLen] = hardwareAddrLength
+	binary.BigEndian.PutUint32(m[msgXID:], xid)
+	copy(m[msgCHAddr:msgCHAddr+chaddrLength], chaddr)
+	copy(m[msgCookie:], magicCookie[:])
+	return m
+}
+
+// isValid returns true if m is long enough to be a DHCP message and has the
+// DHCP magic cookie.
+func (m message) isValid() bool {
+	return len(m) >= msgOptions && [4]byte{m[msgCookie], m[msgCookie+1], m[msgCookie+2], m[msgCookie+3]} == magicCookie
+}
+
+func (m message) op() op { return op(m[msgOp]) }
+
+func (m message) xid() uint32 { return binary.BigEndian.Uint32(m[msgXID:]) }
+
+func (m message) setBroadcast() { binary.BigEndian.PutUint16(m[msgFlags:], flagBroadcast) }
+
+func (m message) setCIAddr(addr tcpip.Address) {
+	copy(m[msgCIAddr:msgCIAddr+header.IPv4AddressSize], addr)
+}
+
+func (m message) yiaddr() tcpip.Address {
+	return tcpip.Address(m[msgYIAddr : msgYIAddr+header.IPv4AddressSize])
+}
+
+func (m message) chaddr() tcpip.LinkAddress {
+	return tcpip.LinkAddress(m[msgCHAddr : msgCHAddr+hardwareAddrLength])
+}
+
+// option is a DHCP option.
+type option struct {
+	code optionCode
+	body []byte
+}
+
+// options is a list of DHCP options.
+type options []option
+
+// encodedLen returns the length of opts once encoded, including the end
+// option.
+func (opts options) encodedLen() int {
+	n := 1
+	for _, opt := range opts {
+		n += 2 + len(opt.body)
+	}
+	return n
+}
+
+// encode encodes opts into b, which must be at least opts.encodedLen() bytes
+// long.
+func (opts options) encode(b []byte) {
+	for _, opt := range opts {
+		b[0] = byte(opt.code)
+		b[1] = byte(len(opt.body))
+		copy(b[2:], opt.body)
+		b = b[2+len(opt.body):]
+	}
+	b[0] = byte(optEnd)
+}
+
+// options parses the options of m. Options that occur more than once are
+// concatenated, as described by RFC 3396.
+func (m message) options() (options, error) {
+	var opts options
+	index := make(map[optionCode]int)
+	b := m[msgOptions:]
+	for len(b) > 0 {
+		code := optionCode(b[0])
+		if code == optEnd {
+			return opts, nil
+		}
+		if code == optPad {
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, fmt.Errorf("option %d is truncated", code)
+		}
+		body := b[2 : 2+int(b[1])]
+		b = b[2+int(b[1]):]
+		if i, ok := index[code]; ok {
+			opts[i].body = append(opts[i].body, body...)
+			continue
+		}
+		index[code] = len(opts)
+		opts = append(opts, option{code: code, body: append([]byte(nil), body...)})
+	}
+	// Some servers omit the end option.
+	return opts, nil
+}
+
+// get returns the body of the option with the given code, and true if it
+// exists.
+func (opts options) get(code optionCode) ([]byte, bool) {
+	for _, opt := range opts {
+		if opt.code == code {
+			return opt.body, true
+		}
+	}
+	return nil, false
+}
+
+// messageType returns the DHCP message type option of opts.
+func (opts options) messageType() (MessageType, error) {
+	body, ok := opts.get(optMessageType)
+	if !ok {
+		return 0, fmt.Errorf("no message type option")
+	}
+	if len(body) != 1 {
+		return 0, fmt.Errorf("message type option has length %d", len(body))
+	}
+	return MessageType(body[0]), nil
+}
+
+// Config is the network configuration leased by a DHCP server.
+type Config struct {
+	// ServerAddress is the address of the DHCP server that granted the
+	// lease.
+	ServerAddress tcpip.Address
+
+	// SubnetMask is the subnet mask of the leased address.
+	SubnetMask tcpip.AddressMask
+
+	// Routers are the addresses of the routers on the subnet, in order of
+	// preference.
+	Routers []tcpip.Address
+
+	// DNS are the addresses of the DNS servers, in order of preference.
+	DNS []tcpip.Address
+
+	// DomainName is the domain name that the client should use when
+	// resolving hostnames. It may be empty.
+	DomainName string
+
+	// LeaseLength is the length of the lease. Zero means that the lease is
+	// infinite.
+	LeaseLength time.Duration
+
+	// RenewalTime is the time after which the client starts to renew the
+	// lease with the server that granted it, T1 in RFC 2131.
+	RenewalTime time.Duration
+
+	// RebindingTime is the time after which the client starts to renew the
+	// lease with any server, T2 in RFC 2131.
+	RebindingTime time.Duration
+}
+
+// decodeConfig returns the configuration described by opts.
+func decodeConfig(opts options) (Config, error) {
+	var cfg Config
+	addrs := func(code optionCode) ([]tcpip.Address, error) {
+		body, _ := opts.get(code)
+		if len(body)%header.IPv4AddressSize != 0 {
+			return nil, fmt.Errorf("option %d has length %d, which isn't a multiple of %d", code, len(body), header.IPv4AddressSize)
+		}
+		var addrs []tcpip.Address
+		for ; len(body) > 0; body = body[header.IPv4AddressSize:] {
+			addrs = append(addrs, tcpip.Address(body[:header.IPv4AddressSize]))
+		}
+		return addrs, nil
+	}
+	duration := func(code optionCode) (time.Duration, bool, error) {
+		body, ok := opts.get(code)
+		if !ok {
+			return 0, false, nil
+		}
+		if len(body) != 4 {
+			return 0, false, fmt.Errorf("option %d has length %d", code, len(body))
+		}
+		secs := binary.BigEndian.Uint32(body)
+		if secs == infiniteLeaseTime {
+			return 0, true, nil
+		}
+		return time.Duration(secs) * time.Second, true, nil
+	}
+
+	if body, ok := opts.get(optServerID); ok {
+		if len(body) != header.IPv4AddressSize {
+			return Config{}, fmt.Errorf("server identifier option has length %d", len(body))
+		}
+		cfg.ServerAddress = tcpip.Address(body)
+	}
+	if body, ok := opts.get(optSubnetMask); ok {
+		if len(body) != header.IPv4AddressSize {
+			return Config{}, fmt.Errorf("subnet mask option has length %d", len(body))
+		}
+		cfg.SubnetMask = tcpip.AddressMask(body)
+	}
+	var err error
+	if cfg.Routers, err = addrs(optRouter); err != nil {
+		return Config{}, err
+	}
+	if cfg.DNS, err = addrs(optDNS); err != nil {
+		return Config{}, err
+	}
+	if body, ok := opts.get(optDomainName); ok {
+		cfg.DomainName = string(body)
+	}
+
+	lease, ok, err := duration(optLeaseTime)
+	if err != nil {
+		return Config{}, err
+	}
+	if !ok {
+		return Config{}, fmt.Errorf("no lease time option")
+	}
+	cfg.LeaseLength = lease
+	if lease == 0 {
+		return cfg, nil
+	}
+	// Default T1 and T2 as recommended by RFC 2131 section 4.4.5.
+	renewal, ok, err := duration(optRenewalTime)
+	if err != nil {
+		return Config{}, err
+	}
+	if !ok || renewal == 0 || renewal > lease {
+		renewal = lease / 2
+	}
+	rebinding, ok, err := duration(optRebindingTime)
+	if err != nil {
+		return Config{}, err
+	}
+	if !ok || rebinding == 0 || rebinding > lease || rebinding < renewal {
+		rebinding = lease * 7 / 8
+		if rebinding < renewal {
+			rebinding = renewal
+		}
+	}
+	cfg.RenewalTime = renewal
+	cfg.RebindingTime = rebinding
+	return cfg, nil
+}
+
+// PrefixLen returns the prefix length of the subnet mask of c. If c has no
+// subnet mask, the prefix length of the class of addr is returned, as
+// described by RFC 2132 section 3.3.
+func (c *Config) PrefixLen(addr tcpip.Address) int {
+	if len(c.SubnetMask) == header.IPv4AddressSize {
+		return c.SubnetMask.Prefix()
+	}
+	switch {
+	case len(addr) != header.IPv4AddressSize:
+		return header.IPv4AddressSize * 8
+	case addr[0] < 128:
+		return 8
+	case addr[0] < 192:
+		return 16
+	default:
+		return 24
+	}
+}
@@ -0,0 +1,454 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	sctpSrcPort  = 0
+	sctpDstPort  = 2
+	sctpVTag     = 4
+	sctpChecksum = 8
+)
+
+const (
+	// SCTPMinimumSize is the size of the SCTP common header, which is the
+	// minimum size of a valid SCTP packet.
+	SCTPMinimumSize = 12
+
+	// SCTPChunkHeaderSize is the size of the type, flags and length fields
+	// that begin every SCTP chunk.
+	SCTPChunkHeaderSize = 4
+
+	// SCTPParamHeaderSize is the size of the type and length fields that
+	// begin every SCTP chunk parameter and error cause.
+	SCTPParamHeaderSize = 4
+
+	// SCTPDataHeaderSize is the size of a DATA chunk excluding user data.
+	SCTPDataHeaderSize = 16
+
+	// SCTPInitHeaderSize is the size of an INIT or INIT ACK chunk excluding
+	// parameters.
+	SCTPInitHeaderSize = 20
+
+	// SCTPSackHeaderSize is the size of a SACK chunk excluding gap ack
+	// blocks and duplicate TSNs.
+	SCTPSackHeaderSize = 16
+
+	// SCTPShutdownSize is the size of a SHUTDOWN chunk.
+	SCTPShutdownSize = 8
+
+	// SCTPProtocolNumber is SCTP's transport protocol number.
+	SCTPProtocolNumber tcpip.TransportProtocolNumber = 132
+)
+
+// SCTPChunkType is the type of an SCTP chunk, as defined in RFC 9260 section
+// 3.2.
+type SCTPChunkType uint8
+
+// SCTP chunk types.
+const (
+	SCTPChunkData             SCTPChunkType = 0
+	SCTPChunkInit             SCTPChunkType = 1
+	SCTPChunkInitAck          SCTPChunkType = 2
+	SCTPChunkSack             SCTPChunkType = 3
+	SCTPChunkHeartbeat        SCTPChunkType = 4
+	SCTPChunkHeartbeatAck     SCTPChunkType = 5
+	SCTPChunkAbort            SCTPChunkType = 6
+	SCTPChunkShutdown         SCTPChunkType = 7
+	SCTPChunkShutdownAck      SCTPChunkType = 8
+	SCTPChunkError            SCTPChunkType = 9
+	SCTPChunkCookieEcho       SCTPChunkType = 10
+	SCTPChunkCookieAck        SCTPChunkType = 11
+	SCTPChunkShutdownComplete SCTPChunkType = 14
+)
+
+// SCTP chunk flags.
+const (
+	// SCTPDataFlagEnd marks the last fragment of a user message.
+	SCTPDataFlagEnd = 1 << 0
+
+	// SCTPDataFlagBeginning marks the first fragment of a user message.
+	SCTPDataFlagBeginning = 1 << 1
+
+	// SCTPDataFlagUnordered marks a user message for unordered delivery.
+	SCTPDataFlagUnordered = 1 << 2
+
+	// SCTPFlagTagReflected is the T bit of ABORT and SHUTDOWN COMPLETE
+	// chunks, which indicates that the sender filled in the receiver's own
+	// verification tag because it had no association.
+	SCTPFlagTagReflected = 1 << 0
+)
+
+// SCTP chunk parameter types used by INIT and INIT ACK chunks, and by
+// HEARTBEAT chunks.
+const (
+	SCTPParamHeartbeatInfo         = 1
+	SCTPParamIPv4Address           = 5
+	SCTPParamIPv6Address           = 6
+	SCTPParamStateCookie           = 7
+	SCTPParamUnrecognized          = 8
+	SCTPParamCookiePreservative    = 9
+	SCTPParamSupportedAddressTypes = 12
+	SCTPParamForwardTSNSupported   = 0xc000
+)
+
+// SCTP error cause codes, as defined in RFC 9260 section 3.3.10.
+const (
+	SCTPCauseInvalidStream      = 1
+	SCTPCauseStaleCookie        = 3
+	SCTPCauseOutOfResource      = 4
+	SCTPCauseUnrecognizedChunk  = 6
+	SCTPCauseNoUserData         = 9
+	SCTPCauseUserInitiatedAbort = 12
+	SCTPCauseProtocolViolation  = 13
+)
+
+// SCTP represents an SCTP packet, starting with its common header, stored in
+// a byte array.
+type SCTP []byte
+
+// SourcePort returns the "source port" field of the SCTP common header.
+func (b SCTP) SourcePort() uint16 {
+	return binary.BigEndian.Uint16(b[sctpSrcPort:])
+}
+
+// DestinationPort returns the "destination port" field of the SCTP common
+// header.
+func (b SCTP) DestinationPort() uint16 {
+	return binary.BigEndian.Uint16(b[sctpDstPort:])
+}
+
+// VerificationTag returns the "verification tag" field of the SCTP common
+// header.
+func (b SCTP) VerificationTag() uint32 {
+	return binary.BigEndian.Uint32(b[sctpVTag:])
+}
+
+// Checksum returns the "checksum" field of the SCTP common header.
+func (b SCTP) Checksum() uint32 {
+	// The CRC32c is transmitted in little-endian order; see RFC 9260
+	// appendix A.
+	return binary.LittleEndian.Uint32(b[sctpChecksum:])
+}
+
+// Chunks returns the chunks contained in the SCTP packet.
+func (b SCTP) Chunks() []byte {
+	return b[SCTPMinimumSize:]
+}
+
+// SetSourcePort sets the "source port" field of the SCTP common header.
+func (b SCTP) SetSourcePort(port uint16) {
+	binary.BigEndian.PutUint16(b[sctpSrcPort:], port)
+}
+
+// SetDestinationPort sets the "destination port" field of the SCTP common
+// header.
+func (b SCTP) SetDestinationPort(port uint16) {
+	binary.BigEndian.PutUint16(b[sctpDstPort:], port)
+}
+
+// SetVerificationTag sets the "verification tag" field of the SCTP common
+// header.
+func (b SCTP) SetVerificationTag(tag uint32) {
+	binary.BigEndian.PutUint32(b[sctpVTag:], tag)
+}
+
+// SetChecksum sets the "checksum" field of the SCTP common header.
+func (b SCTP) SetChecksum(xsum uint32) {
+	binary.LittleEndian.PutUint32(b[sctpChecksum:], xsum)
+}
+
+var sctpCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SCTPChecksum calculates the CRC32c checksum of an SCTP packet consisting of
+// the common header hdr followed by chunks. The checksum field of hdr is
+// treated as zero.
+func SCTPChecksum(hdr SCTP, chunks []byte) uint32 {
+	var zero [4]byte
+	xsum := crc32.Update(0, sctpCRCTable, hdr[:sctpChecksum])
+	xsum = crc32.Update(xsum, sctpCRCTable, zero[:])
+	xsum = crc32.Update(xsum, sctpCRCTable, hdr[sctpChecksum+4:SCTPMinimumSize])
+	return crc32.Update(xsum, sctpCRCTable, chunks)
+}
+
+// SCTPChunk represents a single SCTP chunk stored in a byte array. The array
+// holds exactly Length() bytes, excluding padding.
+type SCTPChunk []byte
+
+// Type returns the "chunk type" field of the chunk.
+func (c SCTPChunk) Type() SCTPChunkType {
+	return SCTPChunkType(c[0])
+}
+
+// Flags returns the "chunk flags" field of the chunk.
+func (c SCTPChunk) Flags() uint8 {
+	return c[1]
+}
+
+// Length returns the "chunk length" field of the chunk.
+func (c SCTPChunk) Length() uint16 {
+	return binary.BigEndian.Uint16(c[2:])
+}
+
+// Value returns the chunk value that follows the chunk header.
+func (c SCTPChunk) Value() []byte {
+	return c[SCTPChunkHeaderSize:]
+}
+
+// SCTPNextChunk parses the first chunk in b. It returns the chunk and the
+// remaining bytes following the chunk and its padding. ok is false if b is
+// empty or does not start with a well-formed chunk.
+func SCTPNextChunk(b []byte) (chunk SCTPChunk, rest []byte, ok bool) {
+	if len(b) < SCTPChunkHeaderSize {
+		return nil, nil, false
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length < SCTPChunkHeaderSize || length > len(b) {
+		return nil, nil, false
+	}
+	padded := sctpPad(length)
+	if padded > len(b) {
+		// The final chunk's padding may be omitted.
+		padded = len(b)
+	}
+	return SCTPChunk(b[:length]), b[padded:], true
+}
+
+// SCTPAppendChunk appends a chunk with the given type, flags and value,
+// followed by any necessary padding, to b.
+func SCTPAppendChunk(b []byte, typ SCTPChunkType, flags uint8, value []byte) []byte {
+	length := SCTPChunkHeaderSize + len(value)
+	b = append(b, byte(typ), flags, byte(length>>8), byte(length))
+	b = append(b, value...)
+	return sctpAppendPadding(b, length)
+}
+
+// SCTPAppendParam appends a parameter or error cause with the given type and
+// value, followed by any necessary padding, to b.
+func SCTPAppendParam(b []byte, typ uint16, value []byte) []byte {
+	length := SCTPParamHeaderSize + len(value)
+	b = append(b, byte(typ>>8), byte(typ), byte(length>>8), byte(length))
+	b = append(b, value...)
+	return sctpAppendPadding(b, length)
+}
+
+// SCTPNextParam parses the first parameter or error cause in b. It returns
+// the parameter's type and value and the bytes following the parameter and
+// its padding. ok is false if b is empty or malformed.
+func SCTPNextParam(b []byte) (typ uint16, value []byte, rest []byte, ok bool) {
+	if len(b) < SCTPParamHeaderSize {
+		return 0, nil, nil, false
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length < SCTPParamHeaderSize || length > len(b) {
+		return 0, nil, nil, false
+	}
+	padded := sctpPad(length)
+	if padded > len(b) {
+		padded = len(b)
+	}
+	return binary.BigEndian.Uint16(b), b[SCTPParamHeaderSize:length], b[padded:], true
+}
+
+func sctpPad(length int) int {
+	return (length + 3) &^ 3
+}
+
+func sctpAppend16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func sctpAppend32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func sctpAppendPadding(b []byte, length int) []byte {
+	for i := length; i < sctpPad(length); i++ {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// SCTPData represents the value of a DATA chunk.
+type SCTPData []byte
+
+// TSN returns the "transmission sequence number" field of the DATA chunk.
+func (d SCTPData) TSN() uint32 {
+	return binary.BigEndian.Uint32(d[0:])
+}
+
+// StreamID returns the "stream identifier" field of the DATA chunk.
+func (d SCTPData) StreamID() uint16 {
+	return binary.BigEndian.Uint16(d[4:])
+}
+
+// StreamSequence returns the "stream sequence number" field of the DATA
+// chunk.
+func (d SCTPData) StreamSequence() uint16 {
+	return binary.BigEndian.Uint16(d[6:])
+}
+
+// PPID returns the "payload protocol identifier" field of the DATA chunk.
+func (d SCTPData) PPID() uint32 {
+	return binary.BigEndian.Uint32(d[8:])
+}
+
+// Payload returns the user data carried by the DATA chunk.
+func (d SCTPData) Payload() []byte {
+	return d[SCTPDataHeaderSize-SCTPChunkHeaderSize:]
+}
+
+// SCTPDataFields contains the fields of a DATA chunk value, excluding user
+// data.
+type SCTPDataFields struct {
+	TSN            uint32
+	StreamID       uint16
+	StreamSequence uint16
+	PPID           uint32
+}
+
+// SCTPAppendData appends a DATA chunk with the given flags, fields and user
+// data to b.
+func SCTPAppendData(b []byte, flags uint8, f SCTPDataFields, payload []byte) []byte {
+	length := SCTPDataHeaderSize + len(payload)
+	b = append(b, byte(SCTPChunkData), flags, byte(length>>8), byte(length))
+	b = sctpAppend32(b, f.TSN)
+	b = sctpAppend16(b, f.StreamID)
+	b = sctpAppend16(b, f.StreamSequence)
+	b = sctpAppend32(b, f.PPID)
+	b = append(b, payload...)
+	return sctpAppendPadding(b, length)
+}
+
+// SCTPInit represents the value of an INIT or INIT ACK chunk.
+type SCTPInit []byte
+
+// InitiateTag returns the "initiate tag" field of the chunk.
+func (c SCTPInit) InitiateTag() uint32 {
+	return binary.BigEndian.Uint32(c[0:])
+}
+
+// ARwnd returns the "advertised receiver window credit" field of the chunk.
+func (c SCTPInit) ARwnd() uint32 {
+	return binary.BigEndian.Uint32(c[4:])
+}
+
+// OutboundStreams returns the "number of outbound streams" field of the
+// chunk.
+func (c SCTPInit) OutboundStreams() uint16 {
+	return binary.BigEndian.Uint16(c[8:])
+}
+
+// InboundStreams returns the "number of inbound streams" field of the chunk.
+func (c SCTPInit) InboundStreams() uint16 {
+	return binary.BigEndian.Uint16(c[10:])
+}
+
+// InitialTSN returns the "initial TSN" field of the chunk.
+func (c SCTPInit) InitialTSN() uint32 {
+	return binary.BigEndian.Uint32(c[12:])
+}
+
+// Params returns the optional and variable-length parameters of the chunk.
+func (c SCTPInit) Params() []byte {
+	return c[SCTPInitHeaderSize-SCTPChunkHeaderSize:]
+}
+
+// SCTPInitFields contains the fixed fields of an INIT or INIT ACK chunk.
+type SCTPInitFields struct {
+	InitiateTag     uint32
+	ARwnd           uint32
+	OutboundStreams uint16
+	InboundStreams  uint16
+	InitialTSN      uint32
+}
+
+// Encode returns the fixed part of an INIT or INIT ACK chunk value.
+func (f *SCTPInitFields) Encode() []byte {
+	b := make([]byte, 0, SCTPInitHeaderSize-SCTPChunkHeaderSize)
+	b = sctpAppend32(b, f.InitiateTag)
+	b = sctpAppend32(b, f.ARwnd)
+	b = sctpAppend16(b, f.OutboundStreams)
+	b = sctpAppend16(b, f.InboundStreams)
+	return sctpAppend32(b, f.InitialTSN)
+}
+
+// SCTPSack represents the value of a SACK chunk.
+type SCTPSack []byte
+
+// CumulativeTSNAck returns the "cumulative TSN ack" field of the chunk.
+func (c SCTPSack) CumulativeTSNAck() uint32 {
+	return binary.BigEndian.Uint32(c[0:])
+}
+
+// ARwnd returns the "advertised receiver window credit" field of the chunk.
+func (c SCTPSack) ARwnd() uint32 {
+	return binary.BigEndian.Uint32(c[4:])
+}
+
+// NumGapBlocks returns the "number of gap ack blocks" field of the chunk.
+func (c SCTPSack) NumGapBlocks() int {
+	return int(binary.BigEndian.Uint16(c[8:]))
+}
+
+// NumDuplicateTSNs returns the "number of duplicate TSNs" field of the chunk.
+func (c SCTPSack) NumDuplicateTSNs() int {
+	return int(binary.BigEndian.Uint16(c[10:]))
+}
+
+// Valid returns true if the chunk is large enough to hold the gap ack blocks
+// and duplicate TSNs it declares.
+func (c SCTPSack) Valid() bool {
+	if len(c) < SCTPSackHeaderSize-SCTPChunkHeaderSize {
+		return false
+	}
+	return len(c) >= SCTPSackHeaderSize-SCTPChunkHeaderSize+4*(c.NumGapBlocks()+c.NumDuplicateTSNs())
+}
+
+// GapBlock returns the start and end offsets, relative to the cumulative TSN
+// ack, of the i'th gap ack block.
+func (c SCTPSack) GapBlock(i int) (start, end uint16) {
+	off := SCTPSackHeaderSize - SCTPChunkHeaderSize + 4*i
+	return binary.BigEndian.Uint16(c[off:]), binary.BigEndian.Uint16(c[off+2:])
+}
+
+// SCTPGapBlock is a gap ack block in a SACK chunk.
+type SCTPGapBlock struct {
+	Start uint16
+	End   uint16
+}
+
+// SCTPEncodeSack returns the value of a SACK chunk.
+func SCTPEncodeSack(cumTSN, arwnd uint32, gaps []SCTPGapBlock, dups []uint32) []byte {
+	b := make([]byte, 0, SCTPSackHeaderSize-SCTPChunkHeaderSize+4*(len(gaps)+len(dups)))
+	b = sctpAppend32(b, cumTSN)
+	b = sctpAppend32(b, arwnd)
+	b = sctpAppend16(b, uint16(len(gaps)))
+	b = sctpAppend16(b, uint16(len(dups)))
+	for _, g := range gaps {
+		b = sctpAppend16(b, g.Start)
+		b = sctpAppend16(b, g.End)
+	}
+	for _, d := range dups {
+		b = sctpAppend32(b, d)
+	}
+	return b
+}
@@ -91,6 +91,8 @@ const (
 	TCPOptionTS            = 8
 	TCPOptionSACKPermitted = 4
 	TCPOptionSACK          = 5
+	TCPOptionMD5Sig        = 19
+	TCPOptionFastOpen      = 34
 )
 
 // Option Lengths.
@@ -99,6 +101,17 @@ const (
 	TCPOptionTSLength            = 10
 	TCPOptionWSLength            = 3
 	TCPOptionSackPermittedLength = 2
+	TCPOptionMD5SigLength        = 18
+	TCPOptionFastOpenMinLength   = 2
+)
+
+// TCPMD5DigestSize is the size of the digest in the TCP MD5 signature option.
+const TCPMD5DigestSize = TCPOptionMD5SigLength - 2
+
+// Sizes of TCP Fast Open cookies, as defined in RFC 7413, section 4.1.1.
+const (
+	TCPFastOpenCookieMinSize = 4
+	TCPFastOpenCookieMaxSize = 16
 )
 
 // TCPFields contains the fields of a TCP packet. It is used to describe the
@@ -158,6 +171,14 @@ type TCPSynOptions struct {
 	// SACKPermitted is true if the SACK option was provided in the SYN/SYN-ACK.
 	SACKPermitted bool
 
+	// FastOpen is true if the TCP Fast Open option was provided in the
+	// SYN/SYN-ACK, either as a cookie request or with a cookie.
+	FastOpen bool
+
+	// FastOpenCookie is the cookie carried by the TCP Fast Open option. It is
+	// empty for a cookie request.
+	FastOpenCookie []byte
+
 	// Flags if specified are set on the outgoing SYN. The SYN flag is
 	// always set.
 	Flags TCPFlags
@@ -498,6 +519,22 @@ func ParseSynOptions(opts []byte, isAck bool) TCPSynOptions {
 			synOpts.SACKPermitted = true
 			i += 2
 
+		case TCPOptionFastOpen:
+			if i+2 > limit {
+				return synOpts
+			}
+			l := int(opts[i+1])
+			if l < TCPOptionFastOpenMinLength || i+l > limit {
+				return synOpts
+			}
+			// Cookies of invalid sizes are ignored, per RFC 7413, section
+			// 4.1.1.
+			if cookieLen := l - TCPOptionFastOpenMinLength; cookieLen == 0 || (cookieLen >= TCPFastOpenCookieMinSize && cookieLen <= TCPFastOpenCookieMaxSize && cookieLen%2 == 0) {
+				synOpts.FastOpen = true
+				synOpts.FastOpenCookie = opts[i+TCPOptionFastOpenMinLength : i+l]
+			}
+			i += l
+
 		default:
 			// We don't recognize this option, just skip over it.
 			if i+2 > limit {
@@ -624,6 +661,20 @@ func EncodeSACKPermittedOption(b []byte) int {
 	return int(b[1])
 }
 
+// EncodeFastOpenOption encodes a TCP Fast Open option with the provided cookie,
+// which is empty for a cookie request, into the provided buffer. If the buffer
+// is smaller than required it just returns without encoding anything. It
+// returns the number of bytes written to the provided buffer.
+func EncodeFastOpenOption(cookie []byte, b []byte) int {
+	l := TCPOptionFastOpenMinLength + len(cookie)
+	if len(b) < l {
+		return 0
+	}
+	b[0], b[1] = TCPOptionFastOpen, byte(l)
+	copy(b[TCPOptionFastOpenMinLength:], cookie)
+	return l
+}
+
 // EncodeSACKBlocks encodes the provided SACK blocks as a TCP SACK option block
 // in the provided slice. It tries to fit in as many blocks as possible based on
 // number of bytes available in the provided buffer. It returns the number of
@@ -653,6 +704,51 @@ func EncodeSACKBlocks(sackBlocks []SACKBlock, b []byte) int {
 	return int(b[1])
 }
 
+// EncodeMD5SigOption encodes a TCP MD5 signature option with the provided
+// digest into the provided buffer. If the buffer is smaller than required it
+// just returns without encoding anything. It returns the number of bytes
+// written to the provided buffer.
+func EncodeMD5SigOption(digest []byte, b []byte) int {
+	if len(b) < TCPOptionMD5SigLength || len(digest) != TCPMD5DigestSize {
+		return 0
+	}
+	b[0], b[1] = TCPOptionMD5Sig, TCPOptionMD5SigLength
+	copy(b[2:], digest)
+	return int(b[1])
+}
+
+// ParseMD5SigOption returns the digest in the TCP MD5 signature option in the
+// provided options, and whether the option was found.
+func ParseMD5SigOption(opts []byte) ([]byte, bool) {
+	limit := len(opts)
+	for i := 0; i < limit; {
+		switch opts[i] {
+		case TCPOptionEOL:
+			return nil, false
+		case TCPOptionNOP:
+			i++
+		default:
+			if i+2 > limit {
+				return nil, false
+			}
+			l := int(opts[i+1])
+			// If the length is incorrect or if l+i overflows the
+			// total options length then stop parsing.
+			if l < 2 || i+l > limit {
+				return nil, false
+			}
+			if opts[i] == TCPOptionMD5Sig {
+				if l != TCPOptionMD5SigLength {
+					return nil, false
+				}
+				return opts[i+2 : i+l], true
+			}
+			i += l
+		}
+	}
+	return nil, false
+}
+
 // EncodeNOP adds an explicit NOP to the option list.
 func EncodeNOP(b []byte) int {
 	if len(b) == 0 {
@@ -15,6 +15,7 @@
 package header_test
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
 
@@ -147,6 +148,70 @@ func TestTCPParseOptions(t *testing.T) {
 	}
 }
 
+func TestMD5SigOption(t *testing.T) {
+	digest := make([]byte, header.TCPMD5DigestSize)
+	for i := range digest {
+		digest[i] = byte(i + 1)
+	}
+
+	b := make([]byte, 2+header.TCPOptionMD5SigLength)
+	offset := header.EncodeNOP(b)
+	offset += header.EncodeNOP(b[offset:])
+	if n := header.EncodeMD5SigOption(digest, b[offset:]); n != header.TCPOptionMD5SigLength {
+		t.Fatalf("EncodeMD5SigOption(%v, _) = %d, want %d", digest, n, header.TCPOptionMD5SigLength)
+	}
+	if got, ok := header.ParseMD5SigOption(b); !ok || !reflect.DeepEqual(got, digest) {
+		t.Errorf("ParseMD5SigOption(%v) = %v, %t, want %v, true", b, got, ok, digest)
+	}
+
+	// The option must not be encoded into a buffer that is too short.
+	if n := header.EncodeMD5SigOption(digest, make([]byte, header.TCPOptionMD5SigLength-1)); n != 0 {
+		t.Errorf("EncodeMD5SigOption into a short buffer = %d, want 0", n)
+	}
+
+	for _, opts := range [][]byte{
+		nil,
+		{header.TCPOptionNOP, header.TCPOptionEOL, header.TCPOptionMD5Sig, header.TCPOptionMD5SigLength},
+		{header.TCPOptionMD5Sig, header.TCPOptionMD5SigLength, 1, 2},
+		{header.TCPOptionMD5Sig, 4, 1, 2},
+		{header.TCPOptionTS, 10, 0, 0, 0, 1, 0, 0, 0, 1},
+	} {
+		if got, ok := header.ParseMD5SigOption(opts); ok {
+			t.Errorf("ParseMD5SigOption(%v) = %v, true, want _, false", opts, got)
+		}
+	}
+}
+
+func TestFastOpenOption(t *testing.T) {
+	cookie := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	for _, c := range [][]byte{nil, cookie} {
+		b := make([]byte, header.TCPOptionFastOpenMinLength+len(c))
+		if n := header.EncodeFastOpenOption(c, b); n != len(b) {
+			t.Fatalf("EncodeFastOpenOption(%v, _) = %d, want %d", c, n, len(b))
+		}
+		opts := header.ParseSynOptions(b, false /* isAck */)
+		if !opts.FastOpen || !bytes.Equal(opts.FastOpenCookie, c) {
+			t.Errorf("ParseSynOptions(%v) = %+v, want FastOpen with cookie %v", b, opts, c)
+		}
+	}
+
+	// The option must not be encoded into a buffer that is too short.
+	if n := header.EncodeFastOpenOption(cookie, make([]byte, len(cookie))); n != 0 {
+		t.Errorf("EncodeFastOpenOption into a short buffer = %d, want 0", n)
+	}
+
+	for _, b := range [][]byte{
+		{header.TCPOptionFastOpen, 3, 1},
+		{header.TCPOptionFastOpen, 5, 1, 2, 3},
+		{header.TCPOptionFastOpen, 4, 1, 2},
+		{header.TCPOptionFastOpen, 20, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18},
+	} {
+		if opts := header.ParseSynOptions(b, false /* isAck */); opts.FastOpen {
+			t.Errorf("ParseSynOptions(%v) = %+v, want no FastOpen", b, opts)
+		}
+	}
+}
+
 func TestTCPFlags(t *testing.T) {
 	for _, tt := range []struct {
 		flags header.TCPFlags
@@ -61,6 +61,9 @@ const (
 	// in the UDP header is 16 bits as per RFC 768.
 	UDPMaximumSize = math.MaxUint16
 
+	// UDPChecksumOffset is the offset of the checksum field in the UDP header.
+	UDPChecksumOffset = udpChecksum
+
 	// UDPProtocolNumber is UDP's transport protocol number.
 	UDPProtocolNumber tcpip.TransportProtocolNumber = 17
 )
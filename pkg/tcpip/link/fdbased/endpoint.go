@@ -32,12 +32,14 @@
 // Similarly if more than one FD's are specified where the underlying FD is not
 // AF_PACKET then it's the caller's responsibility to ensure that all inbound
 // packets on the descriptors are consistently 5 tuple hashed to one of the
-// descriptors to prevent TCP reordering.
+// descriptors to prevent TCP reordering. This is the case for the queues of a
+// multi-queue TAP device (IFF_MULTI_QUEUE), which the host kernel selects by
+// flow hash.
 //
-// Since netstack today does not compute 5 tuple hashes for outgoing packets we
-// only use the first FD to write outbound packets. Once 5 tuple hashes for
-// all outbound packets are available we will make use of all underlying FD's to
-// write outbound packets.
+// Each FD is a queue with its own dispatcher goroutine, which delivers the
+// packets it reads in order. Outbound packets are written to the FD selected
+// by their hash, so that the packets of a flow are written to the same queue.
+// Per-queue counters are available through QueueStats.
 package fdbased
 
 import (
@@ -109,6 +111,21 @@ var _ stack.GSOEndpoint = (*endpoint)(nil)
 type fdInfo struct {
 	fd       int
 	isSocket bool
+
+	// stats holds the counters of the queue backed by fd.
+	stats *QueueStats
+}
+
+// QueueStats holds the counters of a single queue of an endpoint, i.e. one of
+// the FDs it was created with.
+type QueueStats struct {
+	// RxPackets and RxBytes count the packets read from the queue.
+	RxPackets tcpip.StatCounter
+	RxBytes   tcpip.StatCounter
+
+	// TxPackets and TxBytes count the packets written to the queue.
+	TxPackets tcpip.StatCounter
+	TxBytes   tcpip.StatCounter
 }
 
 type endpoint struct {
@@ -306,7 +323,8 @@ func New(opts *Options) (stack.LinkEndpoint, error) {
 		if err != nil {
 			return nil, err
 		}
-		e.fds = append(e.fds, fdInfo{fd: fd, isSocket: isSocket})
+		stats := &QueueStats{}
+		e.fds = append(e.fds, fdInfo{fd: fd, isSocket: isSocket, stats: stats})
 		if isSocket {
 			if opts.GSOMaxSize != 0 {
 				if opts.GvisorGSOEnabled {
@@ -318,7 +336,7 @@ func New(opts *Options) (stack.LinkEndpoint, error) {
 			}
 		}
 
-		inboundDispatcher, err := createInboundDispatcher(e, fd, isSocket, fid)
+		inboundDispatcher, err := createInboundDispatcher(e, fd, isSocket, fid, stats)
 		if err != nil {
 			return nil, fmt.Errorf("createInboundDispatcher(...) = %v", err)
 		}
@@ -328,10 +346,10 @@ func New(opts *Options) (stack.LinkEndpoint, error) {
 	return e, nil
 }
 
-func createInboundDispatcher(e *endpoint, fd int, isSocket bool, fID int32) (linkDispatcher, error) {
+func createInboundDispatcher(e *endpoint, fd int, isSocket bool, fID int32, stats *QueueStats) (linkDispatcher, error) {
 	// By default use the readv() dispatcher as it works with all kinds of
 	// FDs (tap/tun/unix domain sockets and af_packet).
-	inboundDispatcher, err := newReadVDispatcher(fd, e)
+	inboundDispatcher, err := newReadVDispatcher(fd, e, stats)
 	if err != nil {
 		return nil, fmt.Errorf("newReadVDispatcher(%d, %+v) = %v", fd, e, err)
 	}
@@ -371,7 +389,7 @@ func createInboundDispatcher(e *endpoint, fd int, isSocket bool, fID int32) (lin
 
 		switch e.packetDispatchMode {
 		case PacketMMap:
-			inboundDispatcher, err = newPacketMMapDispatcher(fd, e)
+			inboundDispatcher, err = newPacketMMapDispatcher(fd, e, stats)
 			if err != nil {
 				return nil, fmt.Errorf("newPacketMMapDispatcher(%d, %+v) = %v", fd, e, err)
 			}
@@ -379,7 +397,7 @@ func createInboundDispatcher(e *endpoint, fd int, isSocket bool, fID int32) (lin
 			// If the provided FD is a socket then we optimize
 			// packet reads by using recvmmsg() instead of read() to
 			// read packets in a batch.
-			inboundDispatcher, err = newRecvMMsgDispatcher(fd, e)
+			inboundDispatcher, err = newRecvMMsgDispatcher(fd, e, stats)
 			if err != nil {
 				return nil, fmt.Errorf("newRecvMMsgDispatcher(%d, %+v) = %v", fd, e, err)
 			}
@@ -429,6 +447,16 @@ func (e *endpoint) Attach(dispatcher stack.NetworkDispatcher) {
 	}
 }
 
+// QueueStats returns the counters of each queue of e, in the order of
+// Options.FDs.
+func (e *endpoint) QueueStats() []*QueueStats {
+	stats := make([]*QueueStats, 0, len(e.fds))
+	for _, fd := range e.fds {
+		stats = append(stats, fd.stats)
+	}
+	return stats
+}
+
 // IsAttached implements stack.LinkEndpoint.IsAttached.
 func (e *endpoint) IsAttached() bool {
 	return e.dispatcher != nil
@@ -504,8 +532,9 @@ func (h *virtioNetHdr) marshal() []byte {
 const (
 	_VIRTIO_NET_HDR_F_NEEDS_CSUM = 1
 
-	_VIRTIO_NET_HDR_GSO_TCPV4 = 1
-	_VIRTIO_NET_HDR_GSO_TCPV6 = 4
+	_VIRTIO_NET_HDR_GSO_TCPV4  = 1
+	_VIRTIO_NET_HDR_GSO_TCPV6  = 4
+	_VIRTIO_NET_HDR_GSO_UDP_L4 = 5
 )
 
 // AddHeader implements stack.LinkEndpoint.AddHeader.
@@ -542,6 +571,8 @@ func (e *endpoint) writePacket(pkt stack.PacketBufferPtr) tcpip.Error {
 					vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV4
 				case stack.GSOTCPv6:
 					vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV6
+				case stack.GSOUDPL4:
+					vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_UDP_L4
 				default:
 					panic(fmt.Sprintf("Unknown gso type: %v", pkt.GSOOptions.Type))
 				}
@@ -612,6 +643,8 @@ func (e *endpoint) sendBatch(batchFDInfo fdInfo, pkts []stack.PacketBufferPtr) (
 							vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV4
 						case stack.GSOTCPv6:
 							vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_TCPV6
+						case stack.GSOUDPL4:
+							vnetHdr.gsoType = _VIRTIO_NET_HDR_GSO_UDP_L4
 						default:
 							panic(fmt.Sprintf("Unknown gso type: %v", pkt.GSOOptions.Type))
 						}
@@ -703,6 +736,7 @@ func (e *endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error)
 			continue
 		}
 		n, err := e.sendBatch(batchFDInfo, batch)
+		batchFDInfo.stats.countTx(batch[:n])
 		sentPackets += n
 		if err != nil {
 			return sentPackets, err
@@ -714,6 +748,7 @@ func (e *endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error)
 
 	if len(batch) != 0 {
 		n, err := e.sendBatch(batchFDInfo, batch)
+		batchFDInfo.stats.countTx(batch[:n])
 		sentPackets += n
 		if err != nil {
 			return sentPackets, err
@@ -722,6 +757,20 @@ func (e *endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error)
 	return sentPackets, nil
 }
 
+// countTx counts pkts as written to the queue.
+func (s *QueueStats) countTx(pkts []stack.PacketBufferPtr) {
+	for _, pkt := range pkts {
+		s.TxPackets.Increment()
+		s.TxBytes.IncrementBy(uint64(pkt.Size()))
+	}
+}
+
+// countRx counts a packet of n bytes as read from the queue.
+func (s *QueueStats) countRx(n int) {
+	s.RxPackets.Increment()
+	s.RxBytes.IncrementBy(uint64(n))
+}
+
 // InjectOutbound implements stack.InjectableEndpoint.InjectOutbound.
 func (e *endpoint) InjectOutbound(dest tcpip.Address, packet *bufferv2.View) tcpip.Error {
 	return rawfile.NonBlockingWrite(e.fds[0].fd, packet.AsSlice())
@@ -788,7 +837,7 @@ func NewInjectable(fd int, mtu uint32, capabilities stack.LinkEndpointCapabiliti
 	}
 
 	return &InjectableEndpoint{endpoint: endpoint{
-		fds:           []fdInfo{{fd: fd, isSocket: isSocket}},
+		fds:           []fdInfo{{fd: fd, isSocket: isSocket, stats: &QueueStats{}}},
 		mtu:           mtu,
 		caps:          capabilities,
 		writevMaxIovs: rawfile.MaxIovs,
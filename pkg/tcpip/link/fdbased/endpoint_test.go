@@ -583,7 +583,7 @@ func (*fakeNetworkDispatcher) DeliverLinkPacket(tcpip.NetworkProtocolNumber, sta
 func TestDispatchPacketFormat(t *testing.T) {
 	for _, test := range []struct {
 		name          string
-		newDispatcher func(fd int, e *endpoint) (linkDispatcher, error)
+		newDispatcher func(fd int, e *endpoint, stats *QueueStats) (linkDispatcher, error)
 	}{
 		{
 			name:          "readVDispatcher",
@@ -616,10 +616,11 @@ func TestDispatchPacketFormat(t *testing.T) {
 
 			// Create and run dispatcher once.
 			sink := &fakeNetworkDispatcher{}
+			var stats QueueStats
 			d, err := test.newDispatcher(fds[0], &endpoint{
 				hdrSize:    header.EthernetMinimumSize,
 				dispatcher: sink,
-			})
+			}, &stats)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -640,6 +641,14 @@ func TestDispatchPacketFormat(t *testing.T) {
 			if got, want := pkt.Data().Size(), 4; got != want {
 				t.Errorf("pkt.Data().Size() = %d, want %d", got, want)
 			}
+
+			// Verify queue stats.
+			if got, want := stats.RxPackets.Value(), uint64(1); got != want {
+				t.Errorf("stats.RxPackets.Value() = %d, want %d", got, want)
+			}
+			if got, want := stats.RxBytes.Value(), uint64(len(data)); got != want {
+				t.Errorf("stats.RxBytes.Value() = %d, want %d", got, want)
+			}
 		})
 	}
 }
@@ -130,6 +130,9 @@ type packetMMapDispatcher struct {
 	// ringOffset is the current offset into the ring buffer where the next
 	// inbound packet will be placed by the kernel.
 	ringOffset int
+
+	// stats holds the counters of the queue backed by fd.
+	stats *QueueStats
 }
 
 func (*packetMMapDispatcher) release() {}
@@ -173,6 +176,7 @@ func (d *packetMMapDispatcher) dispatch() (bool, tcpip.Error) {
 	if err != nil || stopped {
 		return false, err
 	}
+	d.stats.countRx(pkt.Size())
 	var p tcpip.NetworkProtocolNumber
 	if d.e.hdrSize > 0 {
 		p = header.Ethernet(pkt.AsSlice()).Type()
@@ -19,6 +19,6 @@ package fdbased
 
 // Stubbed out version for non-linux/non-amd64/non-arm64 platforms.
 
-func newPacketMMapDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
+func newPacketMMapDispatcher(fd int, e *endpoint, stats *QueueStats) (linkDispatcher, error) {
 	return nil, nil
 }
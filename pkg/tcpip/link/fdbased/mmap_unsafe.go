@@ -47,7 +47,7 @@ func (t tPacketHdr) setTPStatus(status uint32) {
 	(*atomicbitops.Uint32)(statusPtr).Store(status)
 }
 
-func newPacketMMapDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
+func newPacketMMapDispatcher(fd int, e *endpoint, stats *QueueStats) (linkDispatcher, error) {
 	stopFD, err := stopfd.New()
 	if err != nil {
 		return nil, err
@@ -56,6 +56,7 @@ func newPacketMMapDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
 		StopFD: stopFD,
 		fd:     fd,
 		e:      e,
+		stats:  stats,
 	}
 	pageSize := unix.Getpagesize()
 	if tpBlockSize%pageSize != 0 {
@@ -154,9 +154,12 @@ type readVDispatcher struct {
 
 	// buf is the iovec buffer that contains the packet contents.
 	buf *iovecBuffer
+
+	// stats holds the counters of the queue backed by fd.
+	stats *QueueStats
 }
 
-func newReadVDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
+func newReadVDispatcher(fd int, e *endpoint, stats *QueueStats) (linkDispatcher, error) {
 	stopFD, err := stopfd.New()
 	if err != nil {
 		return nil, err
@@ -165,6 +168,7 @@ func newReadVDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
 		StopFD: stopFD,
 		fd:     fd,
 		e:      e,
+		stats:  stats,
 	}
 	skipsVnetHdr := d.e.gsoKind == stack.HostGSOSupported
 	d.buf = newIovecBuffer(BufConfig, skipsVnetHdr)
@@ -181,6 +185,7 @@ func (d *readVDispatcher) dispatch() (bool, tcpip.Error) {
 	if n <= 0 || err != nil {
 		return false, err
 	}
+	d.stats.countRx(n)
 
 	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
 		Payload: d.buf.pullBuffer(n),
@@ -235,6 +240,9 @@ type recvMMsgDispatcher struct {
 	// array is passed as the parameter to recvmmsg call to retrieve
 	// potentially more than 1 packet per unix.
 	msgHdrs []rawfile.MMsgHdr
+
+	// stats holds the counters of the queue backed by fd.
+	stats *QueueStats
 }
 
 const (
@@ -243,7 +251,7 @@ const (
 	MaxMsgsPerRecv = 8
 )
 
-func newRecvMMsgDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
+func newRecvMMsgDispatcher(fd int, e *endpoint, stats *QueueStats) (linkDispatcher, error) {
 	stopFD, err := stopfd.New()
 	if err != nil {
 		return nil, err
@@ -254,6 +262,7 @@ func newRecvMMsgDispatcher(fd int, e *endpoint) (linkDispatcher, error) {
 		e:       e,
 		bufs:    make([]*iovecBuffer, MaxMsgsPerRecv),
 		msgHdrs: make([]rawfile.MMsgHdr, MaxMsgsPerRecv),
+		stats:   stats,
 	}
 	skipsVnetHdr := d.e.gsoKind == stack.HostGSOSupported
 	for i := range d.bufs {
@@ -294,6 +303,7 @@ func (d *recvMMsgDispatcher) dispatch() (bool, tcpip.Error) {
 	defer func() { pkts.DecRef() }()
 	for k := 0; k < nMsgs; k++ {
 		n := int(d.msgHdrs[k].Len)
+		d.stats.countRx(n)
 		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
 			Payload: d.bufs[k].pullBuffer(n),
 		})
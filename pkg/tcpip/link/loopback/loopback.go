@@ -28,12 +28,20 @@ import (
 
 type endpoint struct {
 	dispatcher stack.NetworkDispatcher
+	mtu        uint32
 }
 
+var _ stack.GSOEndpoint = (*endpoint)(nil)
+
 // New creates a new loopback endpoint. This link-layer endpoint just turns
 // outbound packets into inbound packets.
 func New() stack.LinkEndpoint {
-	return &endpoint{}
+	return NewWithMTU(defaultMTU)
+}
+
+// NewWithMTU creates a new loopback endpoint with the given MTU.
+func NewWithMTU(mtu uint32) stack.LinkEndpoint {
+	return &endpoint{mtu: mtu}
 }
 
 // Attach implements stack.LinkEndpoint.Attach. It just saves the stack network-
@@ -47,10 +55,13 @@ func (e *endpoint) IsAttached() bool {
 	return e.dispatcher != nil
 }
 
-// MTU implements stack.LinkEndpoint.MTU. It returns a constant that matches the
+// defaultMTU is the MTU of loopback endpoints returned by New. It matches the
 // linux loopback interface.
-func (*endpoint) MTU() uint32 {
-	return 65536
+const defaultMTU = 65536
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (e *endpoint) MTU() uint32 {
+	return e.mtu
 }
 
 // Capabilities implements stack.LinkEndpoint.Capabilities. Loopback advertises
@@ -65,6 +76,18 @@ func (*endpoint) MaxHeaderLength() uint16 {
 	return 0
 }
 
+// GSOMaxSize implements stack.GSOEndpoint.GSOMaxSize.
+func (*endpoint) GSOMaxSize() uint32 {
+	return stack.LocalGSOMaxSize
+}
+
+// SupportedGSO implements stack.GSOEndpoint.SupportedGSO. Loopback delivers
+// GSO packets to the inbound side as they are, so segments are never split
+// into MTU-sized packets only to be reassembled by the receiver.
+func (*endpoint) SupportedGSO() stack.SupportedGSO {
+	return stack.GvisorGSOSupported
+}
+
 // LinkAddress returns the link address of this endpoint.
 func (*endpoint) LinkAddress() tcpip.LinkAddress {
 	return ""
@@ -78,7 +101,8 @@ func (e *endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error)
 	for _, pkt := range pkts.AsSlice() {
 		// In order to properly loop back to the inbound side we must create a
 		// fresh packet that only contains the underlying payload with no headers
-		// or struct fields set.
+		// or struct fields set. GSO packets are delivered whole, as if they had
+		// been coalesced by GRO on the inbound side.
 		newPkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
 			Payload: pkt.ToBuffer(),
 		})
@@ -113,6 +113,9 @@ func (qd *queueDispatcher) dispatchLoop() {
 				continue
 			}
 			qd.mu.Unlock()
+			for _, pkt := range batch.AsSlice() {
+				pkt.ReportTransmitted()
+			}
 			_, _ = qd.lower.WritePackets(batch)
 			batch.Reset()
 			qd.mu.Lock()
@@ -0,0 +1,487 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shaper provides a link endpoint that limits the bandwidth of the
+// packets written to and received from a lower link endpoint with token
+// buckets, like the tbf queueing discipline of Linux.
+//
+// Packets that exceed the rate limit of their direction are queued until
+// enough tokens are available, and only dropped when the queue is full. This
+// makes TCP see an increased round trip time rather than loss, which lets it
+// pace itself to the limit.
+package shaper
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/nested"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// DefaultQueueLen is the default maximum number of packets queued in
+	// each direction. It is the default txqueuelen of Linux interfaces.
+	DefaultQueueLen = 1000
+
+	// minBurst is the minimum default burst in bytes. It allows a GSO
+	// segment of maximal size to be sent at once.
+	minBurst = 1 << 16
+
+	// defaultBurstTime is the time it takes to send the default burst at
+	// the limited rate.
+	defaultBurstTime = 10 * time.Millisecond
+)
+
+// Limit is the configuration of the token bucket of one direction.
+type Limit struct {
+	// Rate is the sustained rate in bytes per second. Zero means unlimited.
+	Rate uint64
+
+	// Burst is the size of the bucket in bytes, i.e. the number of bytes
+	// that can be sent at once after a period of inactivity. If zero, it
+	// is the number of bytes sent in 10ms at Rate, and at least 64KiB.
+	Burst uint64
+}
+
+// Unlimited returns true if l doesn't limit bandwidth.
+func (l Limit) Unlimited() bool {
+	return l.Rate == 0
+}
+
+// burst returns the size of the bucket of l in bytes.
+func (l Limit) burst() uint64 {
+	if l.Burst != 0 {
+		return l.Burst
+	}
+	b := l.Rate / uint64(time.Second/defaultBurstTime)
+	if b < minBurst {
+		b = minBurst
+	}
+	return b
+}
+
+// Limits are the limits of both directions of an Endpoint.
+type Limits struct {
+	// Ingress limits the packets received from the lower endpoint.
+	Ingress Limit
+
+	// Egress limits the packets written to the lower endpoint.
+	Egress Limit
+}
+
+// DirectionStats are the counters of one direction of an Endpoint.
+type DirectionStats struct {
+	// Queued is the number of packets that were delayed to conform to the
+	// limit.
+	Queued tcpip.StatCounter
+
+	// Dropped is the number of packets that were dropped because the queue
+	// was full.
+	Dropped tcpip.StatCounter
+}
+
+// Stats are the counters of an Endpoint.
+type Stats struct {
+	Ingress DirectionStats
+	Egress  DirectionStats
+}
+
+// Options configures an Endpoint.
+type Options struct {
+	// Limits are the initial limits of the endpoint.
+	Limits Limits
+
+	// QueueLen is the maximum number of packets queued in each direction.
+	// If zero, DefaultQueueLen is used.
+	QueueLen int
+
+	// Clock is used to refill the token buckets. It must not be nil.
+	Clock tcpip.Clock
+}
+
+var _ stack.LinkEndpoint = (*Endpoint)(nil)
+var _ stack.NetworkDispatcher = (*Endpoint)(nil)
+
+// Endpoint is a link endpoint that limits the bandwidth of each direction of
+// a lower link endpoint.
+type Endpoint struct {
+	nested.Endpoint
+
+	stats   Stats
+	ingress bucket
+	egress  bucket
+}
+
+// New creates a new shaper link endpoint wrapping lower.
+func New(lower stack.LinkEndpoint, opts Options) *Endpoint {
+	queueLen := opts.QueueLen
+	if queueLen == 0 {
+		queueLen = DefaultQueueLen
+	}
+	e := &Endpoint{}
+	e.Endpoint.Init(lower, e)
+	e.ingress.init(opts.Clock, queueLen, opts.Limits.Ingress, &e.stats.Ingress, e.deliverQueued)
+	e.egress.init(opts.Clock, queueLen, opts.Limits.Egress, &e.stats.Egress, e.writeQueued)
+	return e
+}
+
+// Stats returns the counters of e.
+func (e *Endpoint) Stats() *Stats {
+	return &e.stats
+}
+
+// Limits returns the current limits of e.
+func (e *Endpoint) Limits() Limits {
+	return Limits{
+		Ingress: e.ingress.getLimit(),
+		Egress:  e.egress.getLimit(),
+	}
+}
+
+// SetLimits changes the limits of e. Queued packets are sent at the new
+// rates.
+func (e *Endpoint) SetLimits(limits Limits) {
+	e.ingress.setLimit(limits.Ingress)
+	e.egress.setLimit(limits.Egress)
+}
+
+// Attach implements stack.LinkEndpoint.Attach.
+func (e *Endpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.Endpoint.Attach(dispatcher)
+	if dispatcher == nil {
+		// The endpoint is detached, drop the packets that would be sent
+		// to or by the previous dispatcher.
+		e.ingress.flush()
+		e.egress.flush()
+	}
+}
+
+// DeliverNetworkPacket implements stack.NetworkDispatcher.
+func (e *Endpoint) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) {
+	if !e.ingress.active.Load() {
+		e.Endpoint.DeliverNetworkPacket(protocol, pkt)
+		return
+	}
+	// The protocol is kept in the packet while it is queued. The NIC sets
+	// it all the same when the packet is delivered.
+	pkt.NetworkProtocolNumber = protocol
+	e.ingress.admit([]stack.PacketBufferPtr{pkt})
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+//
+// Packets that exceed the egress limit are queued and written later. If the
+// queue is full, the packets that don't fit are dropped and
+// tcpip.ErrNoBufferSpace is returned along with the number of packets that
+// were written or queued.
+func (e *Endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	if !e.egress.active.Load() {
+		return e.Endpoint.WritePackets(pkts)
+	}
+	n := e.egress.admit(pkts.AsSlice())
+	if n != pkts.Len() {
+		return n, &tcpip.ErrNoBufferSpace{}
+	}
+	return n, nil
+}
+
+// deliverQueued delivers packets that conform to the ingress limit to the
+// upper dispatcher.
+func (e *Endpoint) deliverQueued(pkts []stack.PacketBufferPtr) {
+	for _, pkt := range pkts {
+		e.Endpoint.DeliverNetworkPacket(pkt.NetworkProtocolNumber, pkt)
+	}
+}
+
+// writeQueued writes packets that conform to the egress limit to the lower
+// endpoint.
+func (e *Endpoint) writeQueued(pkts []stack.PacketBufferPtr) {
+	var list stack.PacketBufferList
+	for _, pkt := range pkts {
+		list.PushBack(pkt)
+	}
+	// Errors are ignored as for packets written by a queueing discipline:
+	// the stack has already accounted for the packets as transmitted.
+	_, _ = e.Endpoint.WritePackets(list)
+}
+
+// bucket is the token bucket and queue of one direction of an Endpoint.
+//
+// Lock order: mu, sendMu.
+type bucket struct {
+	clock    tcpip.Clock
+	queueLen int
+	stats    *DirectionStats
+
+	// send sends packets that conform to the limit. It is called with
+	// sendMu held, so that packets are sent in order.
+	send func([]stack.PacketBufferPtr)
+
+	// sendMu serializes the calls to send for a limited bucket.
+	sendMu sync.Mutex
+
+	// active is false while packets can bypass the bucket, i.e. while it
+	// is unlimited and no packet is queued or being sent. It is only
+	// changed with mu held.
+	active atomicbitops.Bool
+
+	mu sync.Mutex
+
+	// limit is the configuration of the bucket.
+	//
+	// +checklocks:mu
+	limit Limit
+
+	// tokens is the number of bytes that can be sent without waiting. It
+	// may be negative after sending a packet larger than the burst.
+	//
+	// +checklocks:mu
+	tokens float64
+
+	// last is the time at which tokens was last refilled.
+	//
+	// +checklocks:mu
+	last tcpip.MonotonicTime
+
+	// queue holds the packets waiting for tokens, in order. Each packet
+	// holds a reference.
+	//
+	// +checklocks:mu
+	queue []stack.PacketBufferPtr
+
+	// timer is set while the packets in queue are scheduled to be sent.
+	//
+	// +checklocks:mu
+	timer tcpip.Timer
+
+	// sending is true while packets taken from queue are being sent.
+	//
+	// +checklocks:mu
+	sending bool
+}
+
+// init initializes b.
+//
+// +checklocksignore: we don't have to hold locks during initialization.
+func (b *bucket) init(clock tcpip.Clock, queueLen int, limit Limit, stats *DirectionStats, send func([]stack.PacketBufferPtr)) {
+	b.clock = clock
+	b.queueLen = queueLen
+	b.stats = stats
+	b.send = send
+	b.limit = limit
+	b.tokens = float64(limit.burst())
+	b.last = clock.NowMonotonic()
+	b.updateActiveLocked()
+}
+
+func (b *bucket) getLimit() Limit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limit
+}
+
+// setLimit changes the limit of b.
+func (b *bucket) setLimit(limit Limit) {
+	b.mu.Lock()
+	b.refillLocked()
+	b.limit = limit
+	if burst := float64(limit.burst()); b.tokens > burst {
+		b.tokens = burst
+	}
+	// Reschedule the queued packets for the new rate.
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.queue) != 0 && !b.sending {
+		b.scheduleLocked()
+	}
+	b.updateActiveLocked()
+	b.mu.Unlock()
+}
+
+// admit sends or queues pkts, and returns the number of packets that weren't
+// dropped. The packets that are sent immediately are sent before admit
+// returns, and the caller keeps its references on all packets.
+func (b *bucket) admit(pkts []stack.PacketBufferPtr) int {
+	b.mu.Lock()
+	b.refillLocked()
+	// Packets can only be sent immediately if no packet is waiting before
+	// them.
+	n := 0
+	if len(b.queue) == 0 && !b.sending {
+		for n < len(pkts) && b.conformsLocked(pkts[n]) {
+			n++
+		}
+	}
+	admitted := n
+	for _, pkt := range pkts[n:] {
+		if len(b.queue) >= b.queueLen {
+			b.stats.Dropped.Increment()
+			continue
+		}
+		b.queue = append(b.queue, pkt.IncRef())
+		b.stats.Queued.Increment()
+		admitted++
+	}
+	if len(b.queue) != 0 && b.timer == nil && !b.sending {
+		b.scheduleLocked()
+	}
+	b.updateActiveLocked()
+	if n == 0 {
+		b.mu.Unlock()
+		return admitted
+	}
+	b.sendMu.Lock()
+	b.mu.Unlock()
+	b.send(pkts[:n])
+	b.sendMu.Unlock()
+	return admitted
+}
+
+// drain sends the queued packets that conform to the limit, and schedules
+// the remaining ones to be sent when enough tokens are available.
+func (b *bucket) drain() {
+	b.mu.Lock()
+	b.timer = nil
+	for {
+		b.refillLocked()
+		n := 0
+		for n < len(b.queue) && b.conformsLocked(b.queue[n]) {
+			n++
+		}
+		if n == 0 {
+			break
+		}
+		pkts := make([]stack.PacketBufferPtr, n)
+		copy(pkts, b.queue)
+		b.popLocked(n)
+
+		b.sending = true
+		b.active.Store(true)
+		b.sendMu.Lock()
+		b.mu.Unlock()
+		b.send(pkts)
+		b.sendMu.Unlock()
+		for _, pkt := range pkts {
+			pkt.DecRef()
+		}
+		b.mu.Lock()
+		b.sending = false
+	}
+	if len(b.queue) != 0 && b.timer == nil {
+		b.scheduleLocked()
+	}
+	b.updateActiveLocked()
+	b.mu.Unlock()
+}
+
+// flush drops the queued packets.
+func (b *bucket) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, pkt := range b.queue {
+		pkt.DecRef()
+	}
+	b.popLocked(len(b.queue))
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.updateActiveLocked()
+}
+
+// updateActiveLocked updates b.active after a change of the limit, queue or
+// sending state.
+//
+// +checklocks:b.mu
+func (b *bucket) updateActiveLocked() {
+	b.active.Store(!b.limit.Unlimited() || len(b.queue) != 0 || b.sending)
+}
+
+// popLocked removes the first n packets from the queue without releasing
+// their references.
+//
+// +checklocks:b.mu
+func (b *bucket) popLocked(n int) {
+	for i := range b.queue[:n] {
+		b.queue[i] = stack.PacketBufferPtr{}
+	}
+	b.queue = b.queue[n:]
+	if len(b.queue) == 0 {
+		// Reuse the backing array.
+		b.queue = b.queue[:0:0]
+	}
+}
+
+// costLocked returns the number of tokens needed to send pkt at once. A packet
+// larger than the burst waits for a full bucket, and is then sent on credit.
+//
+// +checklocks:b.mu
+func (b *bucket) costLocked(pkt stack.PacketBufferPtr) float64 {
+	cost := uint64(pkt.Size())
+	if burst := b.limit.burst(); cost > burst {
+		cost = burst
+	}
+	return float64(cost)
+}
+
+// conformsLocked returns true if pkt can be sent now, and takes the tokens
+// it uses if so.
+//
+// +checklocks:b.mu
+func (b *bucket) conformsLocked(pkt stack.PacketBufferPtr) bool {
+	if b.limit.Unlimited() {
+		return true
+	}
+	if b.tokens < b.costLocked(pkt) {
+		return false
+	}
+	b.tokens -= float64(pkt.Size())
+	return true
+}
+
+// refillLocked adds the tokens earned since the last refill.
+//
+// +checklocks:b.mu
+func (b *bucket) refillLocked() {
+	now := b.clock.NowMonotonic()
+	elapsed := now.Sub(b.last)
+	b.last = now
+	if b.limit.Unlimited() {
+		return
+	}
+	b.tokens += elapsed.Seconds() * float64(b.limit.Rate)
+	if burst := float64(b.limit.burst()); b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+// scheduleLocked schedules drain to run when the first queued packet can be
+// sent.
+//
+// +checklocks:b.mu
+func (b *bucket) scheduleLocked() {
+	var wait time.Duration
+	if !b.limit.Unlimited() {
+		if need := b.costLocked(b.queue[0]) - b.tokens; need > 0 {
+			wait = time.Duration(math.Ceil(need / float64(b.limit.Rate) * float64(time.Second)))
+		}
+	}
+	b.timer = b.clock.AfterFunc(wait, b.drain)
+}
@@ -0,0 +1,215 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shaper_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/refsvfs2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/link/shaper"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const packetSize = 500
+
+// countDispatcher counts the packets delivered to it.
+type countDispatcher struct {
+	delivered int
+}
+
+func (d *countDispatcher) DeliverNetworkPacket(tcpip.NetworkProtocolNumber, stack.PacketBufferPtr) {
+	d.delivered++
+}
+
+func (*countDispatcher) DeliverLinkPacket(tcpip.NetworkProtocolNumber, stack.PacketBufferPtr, bool) {
+}
+
+func newPacket() stack.PacketBufferPtr {
+	return stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: bufferv2.MakeWithData(make([]byte, packetSize)),
+	})
+}
+
+func newEndpoint(limits shaper.Limits, queueLen int) (*shaper.Endpoint, *channel.Endpoint, *countDispatcher, *faketime.ManualClock) {
+	clock := faketime.NewManualClock()
+	lower := channel.New(100, 1500, "")
+	ep := shaper.New(lower, shaper.Options{
+		Limits:   limits,
+		QueueLen: queueLen,
+		Clock:    clock,
+	})
+	d := &countDispatcher{}
+	ep.Attach(d)
+	return ep, lower, d, clock
+}
+
+func write(t *testing.T, ep *shaper.Endpoint, n int) (int, tcpip.Error) {
+	t.Helper()
+	var pkts stack.PacketBufferList
+	for i := 0; i < n; i++ {
+		pkts.PushBack(newPacket())
+	}
+	defer pkts.Reset()
+	return ep.WritePackets(pkts)
+}
+
+func TestUnlimited(t *testing.T) {
+	ep, lower, d, _ := newEndpoint(shaper.Limits{}, 0)
+	defer lower.Close()
+
+	if n, err := write(t, ep, 10); n != 10 || err != nil {
+		t.Fatalf("WritePackets(10 packets) = (%d, %v), want (10, nil)", n, err)
+	}
+	if got := lower.Drain(); got != 10 {
+		t.Errorf("got %d packets written, want 10", got)
+	}
+	for i := 0; i < 10; i++ {
+		pkt := newPacket()
+		lower.InjectInbound(header.IPv4ProtocolNumber, pkt)
+		pkt.DecRef()
+	}
+	if d.delivered != 10 {
+		t.Errorf("got %d packets delivered, want 10", d.delivered)
+	}
+	if got := ep.Stats().Egress.Queued.Value(); got != 0 {
+		t.Errorf("got Egress.Queued = %d, want 0", got)
+	}
+}
+
+func TestEgressQueueThenDrop(t *testing.T) {
+	ep, lower, _, clock := newEndpoint(shaper.Limits{
+		Egress: shaper.Limit{Rate: 1000, Burst: 2 * packetSize},
+	}, 2)
+	defer lower.Close()
+
+	// The burst allows 2 packets to be written at once, the next 2 are
+	// queued and the last one is dropped.
+	n, err := write(t, ep, 5)
+	if _, ok := err.(*tcpip.ErrNoBufferSpace); n != 4 || !ok {
+		t.Fatalf("WritePackets(5 packets) = (%d, %v), want (4, %s)", n, err, &tcpip.ErrNoBufferSpace{})
+	}
+	if got := lower.Drain(); got != 2 {
+		t.Errorf("got %d packets written, want 2", got)
+	}
+	stats := ep.Stats()
+	if got := stats.Egress.Queued.Value(); got != 2 {
+		t.Errorf("got Egress.Queued = %d, want 2", got)
+	}
+	if got := stats.Egress.Dropped.Value(); got != 1 {
+		t.Errorf("got Egress.Dropped = %d, want 1", got)
+	}
+
+	// Each queued packet is written once enough tokens are earned.
+	for i := 0; i < 2; i++ {
+		clock.Advance(packetSize*time.Second/1000 - time.Millisecond)
+		if got := lower.Drain(); got != 0 {
+			t.Fatalf("got %d packets written before the tokens were earned, want 0", got)
+		}
+		clock.Advance(time.Millisecond)
+		if got := lower.Drain(); got != 1 {
+			t.Fatalf("got %d packets written after the tokens were earned, want 1", got)
+		}
+	}
+}
+
+func TestIngress(t *testing.T) {
+	ep, lower, d, clock := newEndpoint(shaper.Limits{
+		Ingress: shaper.Limit{Rate: 1000, Burst: packetSize},
+	}, 1)
+	defer lower.Close()
+
+	for i := 0; i < 3; i++ {
+		pkt := newPacket()
+		lower.InjectInbound(header.IPv4ProtocolNumber, pkt)
+		pkt.DecRef()
+	}
+	if d.delivered != 1 {
+		t.Errorf("got %d packets delivered, want 1", d.delivered)
+	}
+	stats := ep.Stats()
+	if got := stats.Ingress.Queued.Value(); got != 1 {
+		t.Errorf("got Ingress.Queued = %d, want 1", got)
+	}
+	if got := stats.Ingress.Dropped.Value(); got != 1 {
+		t.Errorf("got Ingress.Dropped = %d, want 1", got)
+	}
+	clock.Advance(time.Second)
+	if d.delivered != 2 {
+		t.Errorf("got %d packets delivered, want 2", d.delivered)
+	}
+
+	// Egress is not limited.
+	if n, err := write(t, ep, 3); n != 3 || err != nil {
+		t.Fatalf("WritePackets(3 packets) = (%d, %v), want (3, nil)", n, err)
+	}
+	if got := lower.Drain(); got != 3 {
+		t.Errorf("got %d packets written, want 3", got)
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	ep, lower, _, clock := newEndpoint(shaper.Limits{
+		Egress: shaper.Limit{Rate: 1, Burst: packetSize},
+	}, 0)
+	defer lower.Close()
+
+	if n, err := write(t, ep, 3); n != 3 || err != nil {
+		t.Fatalf("WritePackets(3 packets) = (%d, %v), want (3, nil)", n, err)
+	}
+	if got := lower.Drain(); got != 1 {
+		t.Errorf("got %d packets written, want 1", got)
+	}
+
+	// Removing the limit writes the queued packets.
+	ep.SetLimits(shaper.Limits{})
+	if got, want := ep.Limits(), (shaper.Limits{}); got != want {
+		t.Errorf("got Limits() = %+v, want %+v", got, want)
+	}
+	clock.RunImmediatelyScheduledJobs()
+	if got := lower.Drain(); got != 2 {
+		t.Errorf("got %d packets written after removing the limit, want 2", got)
+	}
+}
+
+func TestDetachDropsQueue(t *testing.T) {
+	ep, lower, _, clock := newEndpoint(shaper.Limits{
+		Egress: shaper.Limit{Rate: 1000, Burst: packetSize},
+	}, 0)
+	defer lower.Close()
+
+	if n, err := write(t, ep, 3); n != 3 || err != nil {
+		t.Fatalf("WritePackets(3 packets) = (%d, %v), want (3, nil)", n, err)
+	}
+	ep.Attach(nil)
+	clock.Advance(time.Second)
+	if got := lower.Drain(); got != 1 {
+		t.Errorf("got %d packets written, want 1", got)
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refsvfs2.DoLeakCheck()
+	os.Exit(code)
+}
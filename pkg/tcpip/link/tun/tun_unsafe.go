@@ -36,6 +36,35 @@ func OpenTAP(name string) (int, error) {
 	return open(name, unix.IFF_TAP|unix.IFF_NO_PI)
 }
 
+// OpenTAPQueues opens n queues of the specified multi-queue TAP device, sets
+// them to non-blocking mode, and returns their file descriptors. If n is 1,
+// the device doesn't need to be a multi-queue device.
+func OpenTAPQueues(name string, n int) ([]int, error) {
+	if n == 1 {
+		fd, err := OpenTAP(name)
+		if err == nil {
+			return []int{fd}, nil
+		}
+		// TUNSETIFF fails with EINVAL if IFF_MULTI_QUEUE doesn't match
+		// the flags of an existing device.
+		if err != unix.EINVAL {
+			return nil, err
+		}
+	}
+	fds := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		fd, err := open(name, unix.IFF_TAP|unix.IFF_NO_PI|unix.IFF_MULTI_QUEUE)
+		if err != nil {
+			for _, fd := range fds {
+				unix.Close(fd)
+			}
+			return nil, err
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
 func open(name string, flags uint16) (int, error) {
 	fd, err := unix.Open("/dev/net/tun", unix.O_RDWR, 0)
 	if err != nil {
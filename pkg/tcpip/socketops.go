@@ -15,6 +15,8 @@
 package tcpip
 
 import (
+	"time"
+
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/bufferv2"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -63,6 +65,11 @@ type SocketOptionsHandler interface {
 	// changed. The handler notifies the writers if the send buffer size is
 	// increased with setsockopt(2) for TCP endpoints.
 	WakeupWriters()
+
+	// OnTimestampingOptIDSet is invoked when TimestampingOptID is enabled
+	// with SO_TIMESTAMPING. It returns the initial key of transmit
+	// timestamps, or an error if the option can't be enabled.
+	OnTimestampingOptIDSet() (uint32, Error)
 }
 
 // DefaultSocketOptionsHandler is an embeddable type that implements no-op
@@ -112,6 +119,11 @@ func (*DefaultSocketOptionsHandler) OnSetReceiveBufferSize(v, oldSz int64) (newS
 	return v, nil
 }
 
+// OnTimestampingOptIDSet implements SocketOptionsHandler.OnTimestampingOptIDSet.
+func (*DefaultSocketOptionsHandler) OnTimestampingOptIDSet() (uint32, Error) {
+	return 0, nil
+}
+
 // StackHandler holds methods to access the stack options. These must be
 // implemented by the stack.
 type StackHandler interface {
@@ -213,6 +225,20 @@ type SocketOptions struct {
 	// the incoming packet should be returned as an ancillary message.
 	receiveOriginalDstAddress atomicbitops.Uint32
 
+	// udpGROEnabled is used to specify if consecutive UDP datagrams from the
+	// same flow may be coalesced into a single read.
+	udpGROEnabled atomicbitops.Uint32
+
+	// freeBindEnabled determines whether the socket may be bound to an address
+	// that isn't (yet) assigned to an interface, as for IP_FREEBIND and
+	// IPV6_FREEBIND.
+	freeBindEnabled atomicbitops.Uint32
+
+	// transparentEnabled determines whether the socket may be bound to, and
+	// send from, non-local addresses, and receive packets diverted to it by
+	// the TPROXY target, as for IP_TRANSPARENT and IPV6_TRANSPARENT.
+	transparentEnabled atomicbitops.Uint32
+
 	// ipv4RecvErrEnabled determines whether extended reliable error message
 	// passing is enabled for IPv4.
 	ipv4RecvErrEnabled atomicbitops.Uint32
@@ -225,6 +251,36 @@ type SocketOptions struct {
 	errQueueMu sync.Mutex `state:"nosave"`
 	errQueue   sockErrorList
 
+	// txTimestampBytes is the memory used by the transmit timestamps in
+	// errQueue. It is protected by errQueueMu.
+	txTimestampBytes int64
+
+	// timestamping holds the TimestampingFlags set with SO_TIMESTAMPING.
+	timestamping atomicbitops.Uint32
+
+	// timestampingKey is the key of the next transmit timestamp of a
+	// datagram socket, or the offset in the stream from which keys of
+	// transmit timestamps are counted for a stream socket.
+	timestampingKey atomicbitops.Uint32
+
+	// zeroCopyEnabled determines whether MSG_ZEROCOPY sends are enabled, as
+	// for SO_ZEROCOPY.
+	zeroCopyEnabled atomicbitops.Uint32
+
+	// zeroCopyMu protects the below fields.
+	zeroCopyMu sync.Mutex `state:"nosave"`
+
+	// zeroCopyKey is the notification ID of the next MSG_ZEROCOPY send.
+	zeroCopyKey uint32
+
+	// zeroCopyReleased is the offset up to which the endpoint has released
+	// the data in its send queue; see ReleaseZeroCopySends.
+	zeroCopyReleased uint64
+
+	// zeroCopySends are the MSG_ZEROCOPY sends whose completion hasn't been
+	// notified, in order of their notification IDs.
+	zeroCopySends []zeroCopySend
+
 	// bindToDevice determines the device to which the socket is bound.
 	bindToDevice atomicbitops.Int32
 
@@ -254,6 +310,34 @@ type SocketOptions struct {
 	// rcvlowat specifies the minimum number of bytes which should be
 	// received to indicate the socket as readable.
 	rcvlowat atomicbitops.Int32
+
+	// maxPacingRate is one more than the SO_MAX_PACING_RATE value, so that
+	// the zero value (math.MaxUint64 wrapped around) means unlimited, which
+	// is the default.
+	maxPacingRate atomicbitops.Uint64
+
+	// busyPoll is the SO_BUSY_POLL value: the time that blocking reads busy
+	// poll for received data before sleeping, in microseconds.
+	busyPoll atomicbitops.Uint32
+
+	// incomingCPU is one more than the SO_INCOMING_CPU value, the CPU on
+	// which data was last received through the socket, so that the zero value
+	// means -1, which is the default.
+	incomingCPU atomicbitops.Int32
+
+	// filterAttached is 1 if filter is non-nil. It lets the receive path
+	// skip filterMu for sockets without a filter.
+	filterAttached atomicbitops.Uint32
+
+	// filterMu protects the below fields.
+	filterMu sync.RWMutex `state:"nosave"`
+
+	// filter is the socket filter attached with SO_ATTACH_FILTER, if any.
+	filter SocketFilter
+
+	// filterLocked determines whether the attached filter, or its absence,
+	// can no longer be changed, as for SO_LOCK_FILTER.
+	filterLocked bool
 }
 
 // InitHandler initializes the handler. This must be called before using the
@@ -341,6 +425,54 @@ func (so *SocketOptions) SetKeepAlive(v bool) {
 	so.handler.OnKeepAliveSet(v)
 }
 
+// GetZeroCopy gets value for SO_ZEROCOPY option.
+func (so *SocketOptions) GetZeroCopy() bool {
+	return so.zeroCopyEnabled.Load() != 0
+}
+
+// SetZeroCopy sets value for SO_ZEROCOPY option.
+func (so *SocketOptions) SetZeroCopy(v bool) {
+	storeAtomicBool(&so.zeroCopyEnabled, v)
+}
+
+// GetTimestamping gets value for SO_TIMESTAMPING option.
+func (so *SocketOptions) GetTimestamping() TimestampingFlags {
+	return TimestampingFlags(so.timestamping.Load())
+}
+
+// SetTimestamping sets value for SO_TIMESTAMPING option. As in Linux,
+// enabling TimestampingOptID resets the key of transmit timestamps.
+func (so *SocketOptions) SetTimestamping(flags TimestampingFlags) Error {
+	if flags&TimestampingOptID != 0 && so.GetTimestamping()&TimestampingOptID == 0 {
+		key, err := so.handler.OnTimestampingOptIDSet()
+		if err != nil {
+			return err
+		}
+		so.timestampingKey.Store(key)
+	}
+	so.timestamping.Store(uint32(flags))
+	return nil
+}
+
+// NextDatagramTimestampingKey returns the key of the transmit timestamp of a
+// datagram, and advances it.
+func (so *SocketOptions) NextDatagramTimestampingKey() uint32 {
+	if so.GetTimestamping()&TimestampingOptID == 0 {
+		return 0
+	}
+	return so.timestampingKey.Add(1) - 1
+}
+
+// StreamTimestampingKey returns the key of the transmit timestamp of data
+// that ends at offset end of a stream. As in Linux, it is the offset of the
+// last byte relative to the offset returned by OnTimestampingOptIDSet.
+func (so *SocketOptions) StreamTimestampingKey(end uint64) uint32 {
+	if so.GetTimestamping()&TimestampingOptID == 0 {
+		return 0
+	}
+	return uint32(end-1) - so.timestampingKey.Load()
+}
+
 // GetMulticastLoop gets value for IP_MULTICAST_LOOP option.
 func (so *SocketOptions) GetMulticastLoop() bool {
 	return so.multicastLoopEnabled.Load() != 0
@@ -475,6 +607,36 @@ func (so *SocketOptions) SetReceiveOriginalDstAddress(v bool) {
 	storeAtomicBool(&so.receiveOriginalDstAddress, v)
 }
 
+// GetUDPGRO gets value for UDP_GRO option.
+func (so *SocketOptions) GetUDPGRO() bool {
+	return so.udpGROEnabled.Load() != 0
+}
+
+// SetUDPGRO sets value for UDP_GRO option.
+func (so *SocketOptions) SetUDPGRO(v bool) {
+	storeAtomicBool(&so.udpGROEnabled, v)
+}
+
+// GetFreeBind gets value for IP_FREEBIND and IPV6_FREEBIND options.
+func (so *SocketOptions) GetFreeBind() bool {
+	return so.freeBindEnabled.Load() != 0
+}
+
+// SetFreeBind sets value for IP_FREEBIND and IPV6_FREEBIND options.
+func (so *SocketOptions) SetFreeBind(v bool) {
+	storeAtomicBool(&so.freeBindEnabled, v)
+}
+
+// GetTransparent gets value for IP_TRANSPARENT and IPV6_TRANSPARENT options.
+func (so *SocketOptions) GetTransparent() bool {
+	return so.transparentEnabled.Load() != 0
+}
+
+// SetTransparent sets value for IP_TRANSPARENT and IPV6_TRANSPARENT options.
+func (so *SocketOptions) SetTransparent(v bool) {
+	storeAtomicBool(&so.transparentEnabled, v)
+}
+
 // GetIPv4RecvError gets value for IP_RECVERR option.
 func (so *SocketOptions) GetIPv4RecvError() bool {
 	return so.ipv4RecvErrEnabled.Load() != 0
@@ -545,6 +707,14 @@ const (
 
 	// SockExtErrorOriginICMP6 indicates an IPv6 ICMP error.
 	SockExtErrorOriginICMP6
+
+	// SockExtErrorOriginZeroCopy indicates a MSG_ZEROCOPY completion
+	// notification.
+	SockExtErrorOriginZeroCopy
+
+	// SockExtErrorOriginTimestamping indicates a SO_TIMESTAMPING transmit
+	// timestamp.
+	SockExtErrorOriginTimestamping
 )
 
 // IsICMPErr indicates if the error originated from an ICMP error.
@@ -594,6 +764,112 @@ func (l *LocalSockError) Info() uint32 {
 	return l.info
 }
 
+// ZeroCopySockError is a completion notification for the MSG_ZEROCOPY sends
+// with notification IDs in the range [Lo, Hi].
+//
+// +stateify savable
+type ZeroCopySockError struct {
+	// Lo and Hi are the first and last notification IDs of the completed
+	// sends, inclusive.
+	Lo uint32
+	Hi uint32
+
+	// Copied is true if the data of the sends was copied rather than sent
+	// directly from the application's buffers.
+	Copied bool
+}
+
+// Origin implements SockErrorCause.
+func (*ZeroCopySockError) Origin() SockErrOrigin {
+	return SockExtErrorOriginZeroCopy
+}
+
+// Type implements SockErrorCause.
+func (*ZeroCopySockError) Type() uint8 {
+	return 0
+}
+
+// Code implements SockErrorCause.
+func (z *ZeroCopySockError) Code() uint8 {
+	if z.Copied {
+		return 1 // SO_EE_CODE_ZEROCOPY_COPIED
+	}
+	return 0
+}
+
+// Info implements SockErrorCause.
+func (z *ZeroCopySockError) Info() uint32 {
+	return z.Lo
+}
+
+// TimestampingFlags are the flags of the SO_TIMESTAMPING option. They have
+// the values of the corresponding SOF_TIMESTAMPING_* flags in Linux.
+type TimestampingFlags uint32
+
+// TimestampingFlags used by netstack. Hardware timestamps are never
+// generated.
+const (
+	// TimestampingTXSoftware requests software timestamps of packets when
+	// they are handed to the link endpoint.
+	TimestampingTXSoftware TimestampingFlags = 1 << 1
+
+	// TimestampingRXSoftware requests software timestamps of received
+	// packets.
+	TimestampingRXSoftware TimestampingFlags = 1 << 3
+
+	// TimestampingSoftware reports software timestamps in control messages.
+	TimestampingSoftware TimestampingFlags = 1 << 4
+
+	// TimestampingOptID identifies transmit timestamps with a key.
+	TimestampingOptID TimestampingFlags = 1 << 7
+
+	// TimestampingOptTSOnly omits the packet from transmit timestamps.
+	TimestampingOptTSOnly TimestampingFlags = 1 << 11
+
+	// TimestampingOptRXFilter reports receive timestamps only if
+	// TimestampingRXSoftware is set.
+	TimestampingOptRXFilter TimestampingFlags = 1 << 17
+)
+
+// ReportRXTimestamp returns true if software timestamps of received packets
+// are reported with the flags.
+func (f TimestampingFlags) ReportRXTimestamp() bool {
+	return f&TimestampingSoftware != 0 && (f&TimestampingRXSoftware != 0 || f&TimestampingOptRXFilter == 0)
+}
+
+// TimestampingSockError is a SO_TIMESTAMPING software transmit timestamp.
+//
+// +stateify savable
+type TimestampingSockError struct {
+	// Key identifies the send that the timestamp is for, as for
+	// TimestampingOptID.
+	Key uint32
+
+	// Timestamp is the time at which the packet was handed to the link
+	// endpoint.
+	Timestamp time.Time `state:".(int64)"`
+}
+
+// Origin implements SockErrorCause.
+func (*TimestampingSockError) Origin() SockErrOrigin {
+	return SockExtErrorOriginTimestamping
+}
+
+// Type implements SockErrorCause.
+func (*TimestampingSockError) Type() uint8 {
+	return 0
+}
+
+// Code implements SockErrorCause.
+func (*TimestampingSockError) Code() uint8 {
+	return 0
+}
+
+// Info implements SockErrorCause.
+func (*TimestampingSockError) Info() uint32 {
+	return 0 // SCM_TSTAMP_SND
+}
+
 // SockError represents a queue entry in the per-socket error queue.
 //
 // +stateify savable
@@ -619,6 +895,7 @@ type SockError struct {
 func (so *SocketOptions) pruneErrQueue() {
 	so.errQueueMu.Lock()
 	so.errQueue.Reset()
+	so.txTimestampBytes = 0
 	so.errQueueMu.Unlock()
 }
 
@@ -631,6 +908,9 @@ func (so *SocketOptions) DequeueErr() *SockError {
 	err := so.errQueue.Front()
 	if err != nil {
 		so.errQueue.Remove(err)
+		if _, ok := err.Cause.(*TimestampingSockError); ok {
+			so.txTimestampBytes -= txTimestampSize(err)
+		}
 	}
 	return err
 }
@@ -663,6 +943,181 @@ func (so *SocketOptions) QueueLocalErr(err Error, net NetworkProtocolNumber, inf
 	})
 }
 
+// txTimestampOverhead approximates the memory used by a transmit timestamp in
+// addition to its payload.
+const txTimestampOverhead = 256
+
+func txTimestampSize(err *SockError) int64 {
+	return int64(err.Payload.Size()) + txTimestampOverhead
+}
+
+// QueueTXTimestamp queues a SO_TIMESTAMPING software transmit timestamp with
+// the given key onto the error queue. payload is the transmitted packet, or
+// nil if TimestampingOptTSOnly is set. As in Linux, the timestamp is dropped
+// if the timestamps in the error queue use more memory than the receive
+// buffer size. It returns true if the timestamp was queued.
+func (so *SocketOptions) QueueTXTimestamp(key uint32, timestamp time.Time, net NetworkProtocolNumber, payload *bufferv2.View) bool {
+	err := &SockError{
+		Cause: &TimestampingSockError{
+			Key:       key,
+			Timestamp: timestamp,
+		},
+		Payload:  payload,
+		NetProto: net,
+	}
+	size := txTimestampSize(err)
+	so.errQueueMu.Lock()
+	defer so.errQueueMu.Unlock()
+	if so.txTimestampBytes+size > so.GetReceiveBufferSize() {
+		if payload != nil {
+			payload.Release()
+		}
+		return false
+	}
+	so.txTimestampBytes += size
+	so.errQueue.PushBack(err)
+	return true
+}
+
+// HasQueuedErr returns true if the error queue is not empty.
+func (so *SocketOptions) HasQueuedErr() bool {
+	so.errQueueMu.Lock()
+	defer so.errQueueMu.Unlock()
+	return !so.errQueue.Empty()
+}
+
+// zeroCopySend is a MSG_ZEROCOPY send whose completion hasn't been notified.
+//
+// +stateify savable
+type zeroCopySend struct {
+	// id is the notification ID of the send.
+	id uint32
+
+	// end is the offset in the endpoint's send queue at which the data of the
+	// send ends.
+	end uint64
+
+	// done is true once the send has finished adding data to the send queue.
+	done bool
+
+	// netProto is the network protocol of the socket, which determines the
+	// format of the notification.
+	netProto NetworkProtocolNumber
+}
+
+// StartZeroCopySend allocates a notification ID for a MSG_ZEROCOPY send.
+// Writes that are part of the send must set WriteOptions.ZeroCopyID to the
+// returned ID, and the caller must call FinishZeroCopySend once the send is
+// complete.
+func (so *SocketOptions) StartZeroCopySend(netProto NetworkProtocolNumber) uint32 {
+	so.zeroCopyMu.Lock()
+	defer so.zeroCopyMu.Unlock()
+	id := so.zeroCopyKey
+	so.zeroCopyKey++
+	so.zeroCopySends = append(so.zeroCopySends, zeroCopySend{
+		id:       id,
+		end:      so.zeroCopyReleased,
+		netProto: netProto,
+	})
+	return id
+}
+
+// ExtendZeroCopySend is called by endpoints when they add data written as
+// part of the MSG_ZEROCOPY send with the given ID to their send queue. end is
+// the offset in the send queue at which the data ends.
+func (so *SocketOptions) ExtendZeroCopySend(id uint32, end uint64) {
+	so.zeroCopyMu.Lock()
+	defer so.zeroCopyMu.Unlock()
+	for i := len(so.zeroCopySends) - 1; i >= 0; i-- {
+		if zs := &so.zeroCopySends[i]; zs.id == id {
+			zs.end = end
+			return
+		}
+	}
+}
+
+// FinishZeroCopySend marks the MSG_ZEROCOPY send with the given ID as
+// complete. sent indicates whether any data was written. It returns true if
+// a completion notification was queued.
+func (so *SocketOptions) FinishZeroCopySend(id uint32, sent bool) bool {
+	so.zeroCopyMu.Lock()
+	defer so.zeroCopyMu.Unlock()
+	for i := len(so.zeroCopySends) - 1; i >= 0; i-- {
+		zs := &so.zeroCopySends[i]
+		if zs.id != id {
+			continue
+		}
+		// As in Linux, the notification ID of a send that didn't write any
+		// data is reused by the next send. This is only possible if no other
+		// send has started since.
+		if !sent && so.zeroCopyKey == id+1 {
+			so.zeroCopyKey = id
+			so.zeroCopySends = append(so.zeroCopySends[:i], so.zeroCopySends[i+1:]...)
+			return false
+		}
+		zs.done = true
+		break
+	}
+	return so.completeZeroCopySendsLocked()
+}
+
+// ReleaseZeroCopySends is called by endpoints when the data in their send
+// queue up to offset released is no longer needed, e.g. because it has been
+// acknowledged by the peer. It queues completion notifications for the
+// MSG_ZEROCOPY sends whose data has been released, and returns true if any
+// notifications were queued.
+func (so *SocketOptions) ReleaseZeroCopySends(released uint64) bool {
+	so.zeroCopyMu.Lock()
+	defer so.zeroCopyMu.Unlock()
+	so.zeroCopyReleased = released
+	if len(so.zeroCopySends) == 0 {
+		return false
+	}
+	return so.completeZeroCopySendsLocked()
+}
+
+// +checklocks:so.zeroCopyMu
+func (so *SocketOptions) completeZeroCopySendsLocked() bool {
+	queued := false
+	pending := so.zeroCopySends[:0]
+	for _, zs := range so.zeroCopySends {
+		if !zs.done || zs.end > so.zeroCopyReleased {
+			pending = append(pending, zs)
+			continue
+		}
+		so.queueZeroCopyErr(zs.id, zs.netProto)
+		queued = true
+	}
+	so.zeroCopySends = pending
+	return queued
+}
+
+// queueZeroCopyErr queues a completion notification for the MSG_ZEROCOPY send
+// with the given ID. As in Linux's net/core/skbuff.c:__msg_zerocopy_callback(),
+// the notification is merged into the one at the back of the error queue if
+// their ranges of IDs are contiguous.
+func (so *SocketOptions) queueZeroCopyErr(id uint32, netProto NetworkProtocolNumber) {
+	so.errQueueMu.Lock()
+	defer so.errQueueMu.Unlock()
+	if tail := so.errQueue.Back(); tail != nil {
+		if zc, ok := tail.Cause.(*ZeroCopySockError); ok {
+			if n := uint64(zc.Hi-zc.Lo) + 2; n < 1<<32 && zc.Hi+1 == id {
+				zc.Hi = id
+				return
+			}
+		}
+	}
+	so.errQueue.PushBack(&SockError{
+		Cause: &ZeroCopySockError{
+			Lo: id,
+			Hi: id,
+			// Data is always copied into the endpoint's send queue.
+			Copied: true,
+		},
+		NetProto: netProto,
+	})
+}
+
 // GetBindToDevice gets value for SO_BINDTODEVICE option.
 func (so *SocketOptions) GetBindToDevice() int32 {
 	return so.bindToDevice.Load()
@@ -742,3 +1197,122 @@ func (so *SocketOptions) SetRcvlowat(rcvlowat int32) Error {
 	so.rcvlowat.Store(rcvlowat)
 	return nil
 }
+
+// GetMaxPacingRate gets value for SO_MAX_PACING_RATE option, in bytes per
+// second. math.MaxUint64 means that the rate is unlimited.
+func (so *SocketOptions) GetMaxPacingRate() uint64 {
+	return so.maxPacingRate.Load() - 1
+}
+
+// SetMaxPacingRate sets value for SO_MAX_PACING_RATE option.
+func (so *SocketOptions) SetMaxPacingRate(v uint64) {
+	so.maxPacingRate.Store(v + 1)
+}
+
+// GetBusyPoll gets value for SO_BUSY_POLL option, in microseconds.
+func (so *SocketOptions) GetBusyPoll() uint32 {
+	return so.busyPoll.Load()
+}
+
+// SetBusyPoll sets value for SO_BUSY_POLL option.
+func (so *SocketOptions) SetBusyPoll(usec uint32) {
+	so.busyPoll.Store(usec)
+}
+
+// GetIncomingCPU gets value for SO_INCOMING_CPU option.
+func (so *SocketOptions) GetIncomingCPU() int32 {
+	return so.incomingCPU.Load() - 1
+}
+
+// SetIncomingCPU sets value for SO_INCOMING_CPU option.
+func (so *SocketOptions) SetIncomingCPU(cpu int32) {
+	so.incomingCPU.Store(cpu + 1)
+}
+
+// SocketFilterInfo holds the metadata of a packet that a SocketFilter may
+// inspect in addition to the packet's bytes.
+type SocketFilterInfo struct {
+	// Protocol is the link layer protocol (EtherType) of the packet.
+	Protocol NetworkProtocolNumber
+
+	// PktType is the type of the packet.
+	PktType PacketType
+
+	// NIC is the ID of the NIC the packet was received on.
+	NIC NICID
+}
+
+// SocketFilter is a filter run over the packets received by a socket, as
+// attached with SO_ATTACH_FILTER.
+type SocketFilter interface {
+	// Filter returns the number of leading bytes of data to deliver to the
+	// socket. A return value of 0 means that the packet must be dropped.
+	Filter(data []byte, info SocketFilterInfo) uint32
+}
+
+// HasFilter returns whether a socket filter is attached to the socket.
+func (so *SocketOptions) HasFilter() bool {
+	return so.filterAttached.Load() != 0
+}
+
+// RunFilter runs the attached socket filter, if any, over data and returns
+// the number of bytes of data to deliver to the socket; 0 means that the
+// packet must be dropped. Without a filter, all of data is delivered.
+func (so *SocketOptions) RunFilter(data []byte, info SocketFilterInfo) int {
+	so.filterMu.RLock()
+	defer so.filterMu.RUnlock()
+	if so.filter == nil {
+		return len(data)
+	}
+	if n := so.filter.Filter(data, info); uint64(n) < uint64(len(data)) {
+		return int(n)
+	}
+	return len(data)
+}
+
+// SetFilter attaches filter to the socket, replacing any previously attached
+// filter, as for SO_ATTACH_FILTER.
+func (so *SocketOptions) SetFilter(filter SocketFilter) Error {
+	so.filterMu.Lock()
+	defer so.filterMu.Unlock()
+	if so.filterLocked {
+		return &ErrNotPermitted{}
+	}
+	so.filter = filter
+	storeAtomicBool(&so.filterAttached, filter != nil)
+	return nil
+}
+
+// DetachFilter detaches the attached socket filter, as for SO_DETACH_FILTER.
+func (so *SocketOptions) DetachFilter() Error {
+	so.filterMu.Lock()
+	defer so.filterMu.Unlock()
+	if so.filterLocked {
+		return &ErrNotPermitted{}
+	}
+	if so.filter == nil {
+		return &ErrNoSuchFile{}
+	}
+	so.filter = nil
+	so.filterAttached.Store(0)
+	return nil
+}
+
+// GetFilterLocked gets value for SO_LOCK_FILTER option.
+func (so *SocketOptions) GetFilterLocked() bool {
+	so.filterMu.RLock()
+	defer so.filterMu.RUnlock()
+	return so.filterLocked
+}
+
+// SetFilterLocked sets value for SO_LOCK_FILTER option. Once set, the option
+// can't be cleared.
+func (so *SocketOptions) SetFilterLocked(v bool) Error {
+	so.filterMu.Lock()
+	defer so.filterMu.Unlock()
+	if so.filterLocked && !v {
+		return &ErrNotPermitted{}
+	}
+	so.filterLocked = v
+	return nil
+}
@@ -655,6 +655,45 @@ func (a *AddressableEndpointState) PrimaryAddresses() []tcpip.AddressWithPrefix
 	return addrs
 }
 
+// PrimaryAddressInfo implements AddressableEndpoint.
+func (a *AddressableEndpointState) PrimaryAddressInfo() []AddressInfo {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var infos []AddressInfo
+	enabled := a.networkEndpoint.Enabled()
+	if a.options.HiddenWhileDisabled && !enabled {
+		return infos
+	}
+	for _, ep := range a.primary {
+		ep.mu.RLock()
+		kind := ep.kind
+		info := AddressInfo{
+			AddressWithPrefix: ep.addr,
+			ConfigType:        ep.configType,
+			Lifetimes:         ep.lifetimes,
+		}
+		ep.mu.RUnlock()
+
+		switch kind {
+		case Permanent:
+			info.State = AddressAssigned
+		case PermanentTentative:
+			info.State = AddressTentative
+		case PermanentExpired, Temporary:
+			continue
+		default:
+			panic(fmt.Sprintf("address %s has unknown kind %d", info.AddressWithPrefix, kind))
+		}
+		if !enabled {
+			info.State = AddressDisabled
+		}
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
 // PermanentAddresses implements AddressableEndpoint.
 func (a *AddressableEndpointState) PermanentAddresses() []tcpip.AddressWithPrefix {
 	a.mu.RLock()
@@ -16,6 +16,7 @@ package stack_test
 
 import (
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
@@ -60,3 +61,50 @@ func TestAddressableEndpointStateCleanup(t *testing.T) {
 		t.Fatalf("got s.AcquireAssignedAddress(%s, false, NeverPrimaryEndpoint) = %s, want = nil", addr.Address, ep.AddressWithPrefix())
 	}
 }
+
+// TestAddressableEndpointStatePrimaryAddressInfo tests that the address info
+// of primary addresses reflects their lifetimes and assignment state.
+func TestAddressableEndpointStatePrimaryAddressInfo(t *testing.T) {
+	var ep fakeNetworkEndpoint
+	if err := ep.Enable(); err != nil {
+		t.Fatalf("ep.Enable(): %s", err)
+	}
+
+	var s stack.AddressableEndpointState
+	s.Init(&ep, stack.AddressableEndpointStateOptions{HiddenWhileDisabled: false})
+
+	addr := tcpip.AddressWithPrefix{
+		Address:   "\x01",
+		PrefixLen: 8,
+	}
+	lifetimes := stack.AddressLifetimes{
+		Deprecated: true,
+		ValidUntil: tcpip.MonotonicTime{}.Add(time.Hour),
+	}
+	properties := stack.AddressProperties{Lifetimes: lifetimes}
+	addrEP, err := s.AddAndAcquirePermanentAddress(addr, properties)
+	if err != nil {
+		t.Fatalf("s.AddAndAcquirePermanentAddress(%s, %+v): %s", addr, properties, err)
+	}
+	defer addrEP.DecRef()
+
+	want := stack.AddressInfo{
+		AddressWithPrefix: addr,
+		ConfigType:        stack.AddressConfigStatic,
+		Lifetimes:         lifetimes,
+		State:             stack.AddressAssigned,
+	}
+	if got := s.PrimaryAddressInfo(); len(got) != 1 || got[0] != want {
+		t.Errorf("got s.PrimaryAddressInfo() = %+v, want = [%+v]", got, want)
+	}
+
+	// Unlike PrimaryAddresses, tentative addresses are included.
+	addrEP.SetKind(stack.PermanentTentative)
+	want.State = stack.AddressTentative
+	if got := s.PrimaryAddressInfo(); len(got) != 1 || got[0] != want {
+		t.Errorf("got s.PrimaryAddressInfo() = %+v, want = [%+v]", got, want)
+	}
+	if got := s.PrimaryAddresses(); len(got) != 0 {
+		t.Errorf("got s.PrimaryAddresses() = %s, want = []", got)
+	}
+}
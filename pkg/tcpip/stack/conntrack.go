@@ -43,8 +43,78 @@ const numBuckets = 1 << 14
 const (
 	establishedTimeout   time.Duration = 5 * 24 * time.Hour
 	unestablishedTimeout time.Duration = 120 * time.Second
+
+	// netstack has always used unestablishedTimeout for UDP connections, so
+	// keep it as the default for both UDP timeouts rather than Linux's
+	// shorter defaults.
+	udpTimeout       = unestablishedTimeout
+	udpStreamTimeout = unestablishedTimeout
 )
 
+// DefaultConnTrackMax is the default maximum number of tracked connections,
+// matching Linux's default nf_conntrack_max on most machines.
+const DefaultConnTrackMax = 16 * numBuckets
+
+// maxEvictionCandidates is the number of connections examined by each pass of
+// ConnTrack.evict.
+const maxEvictionCandidates = 64
+
+// ConnTrackTimeouts holds the durations after which idle tracked connections
+// expire. They correspond to Linux's /proc/sys/net/netfilter/nf_conntrack_*
+// sysctls of the same names.
+type ConnTrackTimeouts struct {
+	// TCPEstablished applies to established TCP connections
+	// (nf_conntrack_tcp_timeout_established).
+	TCPEstablished time.Duration
+
+	// UDP applies to UDP connections that have only seen packets in the
+	// original direction (nf_conntrack_udp_timeout).
+	UDP time.Duration
+
+	// UDPStream applies to UDP connections that have seen packets in both
+	// directions (nf_conntrack_udp_timeout_stream).
+	UDPStream time.Duration
+}
+
+// DefaultConnTrackTimeouts returns the default connection tracking timeouts.
+func DefaultConnTrackTimeouts() ConnTrackTimeouts {
+	return ConnTrackTimeouts{
+		TCPEstablished: establishedTimeout,
+		UDP:            udpTimeout,
+		UDPStream:      udpStreamTimeout,
+	}
+}
+
+// ConnTrackTuple identifies a tracked connection in one direction.
+type ConnTrackTuple struct {
+	NetProto   tcpip.NetworkProtocolNumber
+	TransProto tcpip.TransportProtocolNumber
+	SrcAddr    tcpip.Address
+	DstAddr    tcpip.Address
+
+	// SrcPort and DstPort hold the ident of ICMP Echo Request and Echo Reply
+	// packets respectively.
+	SrcPort uint16
+	DstPort uint16
+}
+
+// ConnTrackEntry is a snapshot of a tracked connection.
+type ConnTrackEntry struct {
+	// Original is the tuple of the first packet seen on the connection.
+	Original ConnTrackTuple
+
+	// Reply is the tuple expected of replies, after NAT.
+	Reply ConnTrackTuple
+
+	// State is the Linux name of the state of a TCP connection, e.g.
+	// "ESTABLISHED". It is empty for other protocols.
+	State string
+
+	// Timeout is the time left before the connection expires unless it sees
+	// another packet.
+	Timeout time.Duration
+}
+
 // tuple holds a connection's identifying and manipulating data in one
 // direction. It is immutable.
 //
@@ -160,20 +230,46 @@ type conn struct {
 	//
 	// +checklocks:stateMu
 	lastUsed tcpip.MonotonicTime
+	// timeout is how long the connection may stay idle after lastUsed before
+	// it times out. It is recomputed by each packet on the connection, so
+	// that changes to the ConnTrack's timeouts apply to existing connections
+	// on their next packet.
+	//
+	// +checklocks:stateMu
+	timeout time.Duration
+	// seenReply is true if the connection has seen a packet in the reply
+	// direction.
+	//
+	// +checklocks:stateMu
+	seenReply bool
 }
 
 // timedOut returns whether the connection timed out based on its state.
 func (cn *conn) timedOut(now tcpip.MonotonicTime) bool {
 	cn.stateMu.RLock()
 	defer cn.stateMu.RUnlock()
-	if cn.tcb.State() == tcpconntrack.ResultAlive {
-		// Use the same default as Linux, which doesn't delete
-		// established connections for 5(!) days.
-		return now.Sub(cn.lastUsed) > establishedTimeout
+	return now.Sub(cn.lastUsed) > cn.timeout
+}
+
+// evictable returns whether the connection may be evicted to make room for a
+// new one. Closed and timed out connections are always evictable; if
+// unassured is true, so are connections that never became established.
+func (cn *conn) evictable(now tcpip.MonotonicTime, unassured bool) bool {
+	cn.stateMu.RLock()
+	defer cn.stateMu.RUnlock()
+	if now.Sub(cn.lastUsed) > cn.timeout {
+		return true
 	}
-	// Use the same default as Linux, which lets connections in most states
-	// other than established remain for <= 120 seconds.
-	return now.Sub(cn.lastUsed) > unestablishedTimeout
+	if cn.original.tupleID.transProto == header.TCPProtocolNumber {
+		switch cn.tcb.State() {
+		case tcpconntrack.ResultReset, tcpconntrack.ResultClosedByResponder, tcpconntrack.ResultClosedByOriginator:
+			return true
+		case tcpconntrack.ResultAlive:
+			return false
+		}
+		return unassured
+	}
+	return unassured && !cn.seenReply
 }
 
 // update the connection tracking state.
@@ -183,6 +279,10 @@ func (cn *conn) update(pkt PacketBufferPtr, reply bool) {
 
 	// Mark the connection as having been used recently so it isn't reaped.
 	cn.lastUsed = cn.ct.clock.NowMonotonic()
+	if reply {
+		cn.seenReply = true
+	}
+	defer cn.updateTimeoutLocked()
 
 	if pkt.TransportProtocolNumber != header.TCPProtocolNumber {
 		return
@@ -205,6 +305,56 @@ func (cn *conn) update(pkt PacketBufferPtr, reply bool) {
 	}
 }
 
+// updateTimeoutLocked sets the connection's timeout from its state and the
+// current timeouts of its ConnTrack.
+//
+// +checklocks:cn.stateMu
+func (cn *conn) updateTimeoutLocked() {
+	switch cn.original.tupleID.transProto {
+	case header.TCPProtocolNumber:
+		if cn.tcb.State() == tcpconntrack.ResultAlive {
+			// Use the same default as Linux, which doesn't delete
+			// established connections for 5(!) days.
+			cn.timeout = cn.ct.timeout(&cn.ct.tcpEstablishedTimeout, establishedTimeout)
+			return
+		}
+	case header.UDPProtocolNumber:
+		if cn.seenReply {
+			cn.timeout = cn.ct.timeout(&cn.ct.udpStreamTimeout, udpStreamTimeout)
+		} else {
+			cn.timeout = cn.ct.timeout(&cn.ct.udpTimeout, udpTimeout)
+		}
+		return
+	}
+	// Use the same default as Linux, which lets connections in most states
+	// other than established remain for <= 120 seconds.
+	cn.timeout = unestablishedTimeout
+}
+
+// stateRLocked returns the Linux name of the state of a TCP connection.
+//
+// +checklocksread:cn.stateMu
+func (cn *conn) stateRLocked() string {
+	if cn.original.tupleID.transProto != header.TCPProtocolNumber {
+		return ""
+	}
+	switch cn.tcb.State() {
+	case tcpconntrack.ResultConnecting:
+		if cn.seenReply {
+			return "SYN_RECV"
+		}
+		return "SYN_SENT"
+	case tcpconntrack.ResultAlive:
+		return "ESTABLISHED"
+	case tcpconntrack.ResultClosedByResponder, tcpconntrack.ResultClosedByOriginator:
+		return "TIME_WAIT"
+	case tcpconntrack.ResultReset:
+		return "CLOSE"
+	default:
+		return "NONE"
+	}
+}
+
 // ConnTrack tracks all connections created for NAT rules. Most users are
 // expected to only call handlePacket, insertRedirectConn, and maybeInsertNoop.
 //
@@ -236,6 +386,20 @@ type ConnTrack struct {
 	//
 	// +checklocks:mu
 	buckets []bucket
+
+	// tcpEstablishedTimeout, udpTimeout and udpStreamTimeout hold the
+	// fields of ConnTrackTimeouts in nanoseconds. Zero selects the default.
+	tcpEstablishedTimeout atomicbitops.Int64
+	udpTimeout            atomicbitops.Int64
+	udpStreamTimeout      atomicbitops.Int64
+
+	// max is the maximum number of tracked connections, or 0 if the number
+	// of connections is unlimited. It may be briefly exceeded by concurrent
+	// insertions.
+	max atomicbitops.Int64
+
+	// count is the number of tracked connections.
+	count atomicbitops.Int64
 }
 
 // +stateify savable
@@ -497,6 +661,144 @@ func (ct *ConnTrack) init() {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
 	ct.buckets = make([]bucket, numBuckets)
+	ct.count.Store(0)
+}
+
+// timeout returns the duration held by v, or def if v is zero.
+func (ct *ConnTrack) timeout(v *atomicbitops.Int64, def time.Duration) time.Duration {
+	if d := time.Duration(v.Load()); d != 0 {
+		return d
+	}
+	return def
+}
+
+// Timeouts returns the timeouts of tracked connections.
+func (ct *ConnTrack) Timeouts() ConnTrackTimeouts {
+	return ConnTrackTimeouts{
+		TCPEstablished: ct.timeout(&ct.tcpEstablishedTimeout, establishedTimeout),
+		UDP:            ct.timeout(&ct.udpTimeout, udpTimeout),
+		UDPStream:      ct.timeout(&ct.udpStreamTimeout, udpStreamTimeout),
+	}
+}
+
+// SetTimeouts sets the timeouts of tracked connections. Zero fields restore
+// the default. Existing connections adopt the new timeouts when they next see
+// a packet.
+func (ct *ConnTrack) SetTimeouts(timeouts ConnTrackTimeouts) {
+	ct.tcpEstablishedTimeout.Store(int64(timeouts.TCPEstablished))
+	ct.udpTimeout.Store(int64(timeouts.UDP))
+	ct.udpStreamTimeout.Store(int64(timeouts.UDPStream))
+}
+
+// Max returns the maximum number of tracked connections, or 0 if it is
+// unlimited.
+func (ct *ConnTrack) Max() int {
+	return int(ct.max.Load())
+}
+
+// SetMax sets the maximum number of tracked connections. 0 removes the limit.
+// If the table holds more connections than the new maximum, connections are
+// evicted as new ones are tracked.
+func (ct *ConnTrack) SetMax(max int) {
+	ct.max.Store(int64(max))
+}
+
+// Count returns the number of tracked connections.
+func (ct *ConnTrack) Count() int {
+	return int(ct.count.Load())
+}
+
+// Entries returns a snapshot of the tracked connections.
+func (ct *ConnTrack) Entries() []ConnTrackEntry {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	var entries []ConnTrackEntry
+	now := ct.clock.NowMonotonic()
+	for i := range ct.buckets {
+		bkt := &ct.buckets[i]
+		bkt.mu.RLock()
+		for t := bkt.tuples.Front(); t != nil; t = t.Next() {
+			// Each connection is reported once, through its original tuple.
+			if t.reply {
+				continue
+			}
+			entries = append(entries, t.conn.entry(now))
+		}
+		bkt.mu.RUnlock()
+	}
+	return entries
+}
+
+// entry returns a snapshot of the connection.
+func (cn *conn) entry(now tcpip.MonotonicTime) ConnTrackEntry {
+	var e ConnTrackEntry
+	cn.mu.RLock()
+	e.Original = cn.original.tupleID.connTrackTuple()
+	e.Reply = cn.reply.tupleID.connTrackTuple()
+	cn.mu.RUnlock()
+
+	cn.stateMu.RLock()
+	defer cn.stateMu.RUnlock()
+	e.State = cn.stateRLocked()
+	if e.Timeout = cn.timeout - now.Sub(cn.lastUsed); e.Timeout < 0 {
+		e.Timeout = 0
+	}
+	return e
+}
+
+// connTrackTuple returns the exported form of ti.
+func (ti tupleID) connTrackTuple() ConnTrackTuple {
+	return ConnTrackTuple{
+		NetProto:   ti.netProto,
+		TransProto: ti.transProto,
+		SrcAddr:    ti.srcAddr,
+		DstAddr:    ti.dstAddr,
+		SrcPort:    ti.srcPortOrEchoRequestIdent,
+		DstPort:    ti.dstPortOrEchoReplyIdent,
+	}
+}
+
+// makeRoom returns whether a new connection may be tracked, evicting
+// connections from the table if it is full.
+func (ct *ConnTrack) makeRoom(start int, now tcpip.MonotonicTime) bool {
+	max := ct.max.Load()
+	if max == 0 || ct.count.Load() < max {
+		return true
+	}
+	// Prefer evicting closed and timed out connections, which are dead
+	// anyway, to connections that are still being established.
+	return ct.evict(start, now, max, false /* unassured */) || ct.evict(start, now, max, true /* unassured */)
+}
+
+// evict removes evictable connections from the table, examining up to
+// maxEvictionCandidates connections starting from the bucket at index start,
+// until the table holds less than max connections. It returns whether it
+// succeeded.
+func (ct *ConnTrack) evict(start int, now tcpip.MonotonicTime, max int64, unassured bool) bool {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	examined := 0
+	for i := 0; i < len(ct.buckets) && examined < maxEvictionCandidates; i++ {
+		idx := (i + start) % len(ct.buckets)
+		bkt := &ct.buckets[idx]
+		bkt.mu.Lock()
+		for tuple := bkt.tuples.Front(); tuple != nil && examined < maxEvictionCandidates; {
+			// removeTupleLocked updates tuple's next pointer so we grab it
+			// here.
+			nextTuple := tuple.Next()
+			examined++
+			if tuple.conn.evictable(now, unassured) {
+				ct.removeTupleLocked(tuple, idx, bkt)
+			}
+			tuple = nextTuple
+		}
+		bkt.mu.Unlock()
+		if ct.count.Load() < max {
+			return true
+		}
+	}
+	return false
 }
 
 // getConnAndUpdate attempts to get a connection or creates one if no
@@ -504,8 +806,12 @@ func (ct *ConnTrack) init() {
 //
 // If the packet's protocol is trackable, the connection's state is updated to
 // match the contents of the packet.
-func (ct *ConnTrack) getConnAndUpdate(pkt PacketBufferPtr, skipChecksumValidation bool) *tuple {
+//
+// getConnAndUpdate returns false if the packet must be dropped because it
+// would create a connection while the table is full, like Linux does.
+func (ct *ConnTrack) getConnAndUpdate(pkt PacketBufferPtr, skipChecksumValidation bool) (*tuple, bool) {
 	// Get or (maybe) create a connection.
+	full := false
 	t := func() *tuple {
 		var allowNewConn bool
 		tid, res := getTupleID(pkt)
@@ -563,6 +869,11 @@ func (ct *ConnTrack) getConnAndUpdate(pkt PacketBufferPtr, skipChecksumValidatio
 			return nil
 		}
 
+		if !ct.makeRoom(bktID, now) {
+			full = true
+			return nil
+		}
+
 		bkt.mu.Lock()
 		defer bkt.mu.Unlock()
 
@@ -579,6 +890,7 @@ func (ct *ConnTrack) getConnAndUpdate(pkt PacketBufferPtr, skipChecksumValidatio
 			original: tuple{tupleID: tid},
 			reply:    tuple{tupleID: tid.reply(), reply: true},
 			lastUsed: now,
+			timeout:  unestablishedTimeout,
 		}
 		conn.original.conn = conn
 		conn.reply.conn = conn
@@ -594,12 +906,13 @@ func (ct *ConnTrack) getConnAndUpdate(pkt PacketBufferPtr, skipChecksumValidatio
 		//
 		// See (*conn).finalize.
 		bkt.tuples.PushFront(&conn.original)
+		ct.count.Add(1)
 		return &conn.original
 	}()
 	if t != nil {
 		t.conn.update(pkt, t.reply)
 	}
-	return t
+	return t, !full
 }
 
 func (ct *ConnTrack) connForTID(tid tupleID) *tuple {
@@ -668,6 +981,7 @@ func (ct *ConnTrack) finalize(cn *conn) finalizeResult {
 	bkt.mu.Lock()
 	defer bkt.mu.Unlock()
 	bkt.tuples.Remove(&cn.original)
+	ct.count.Add(-1)
 	return finalizeResultConflict
 }
 
@@ -857,7 +1171,7 @@ func (cn *conn) handlePacket(pkt PacketBufferPtr, hook Hook, rt *Route) bool {
 		dnat = true
 		fallthrough
 	case Postrouting:
-		if pkt.TransportProtocolNumber == header.TCPProtocolNumber && pkt.GSOOptions.Type != GSONone && pkt.GSOOptions.NeedsCsum {
+		if (pkt.TransportProtocolNumber == header.TCPProtocolNumber || pkt.TransportProtocolNumber == header.UDPProtocolNumber) && pkt.GSOOptions.Type != GSONone && pkt.GSOOptions.NeedsCsum {
 			updatePseudoHeader = true
 		} else if rt.RequiresTXTransportChecksum() {
 			fullChecksum = true
@@ -1068,7 +1382,20 @@ func (ct *ConnTrack) reapTupleLocked(reapingTuple *tuple, bktID int, bkt *bucket
 	if !reapingTuple.conn.timedOut(now) {
 		return false
 	}
+	ct.removeTupleLocked(reapingTuple, bktID, bkt)
+	return true
+}
 
+// removeTupleLocked removes tuple and its reply from the table.
+//
+// To maintain lock order, nothing is removed if the tuple for the other
+// direction appears earlier in the table; the connection is removed when
+// the other tuple's bucket is examined instead.
+//
+// Precondition: ct.mu is read locked and bkt.mu is write locked.
+// +checklocksread:ct.mu
+// +checklocks:bkt.mu
+func (ct *ConnTrack) removeTupleLocked(reapingTuple *tuple, bktID int, bkt *bucket) {
 	var otherTuple *tuple
 	if reapingTuple.reply {
 		otherTuple = &reapingTuple.conn.original
@@ -1082,14 +1409,15 @@ func (ct *ConnTrack) reapTupleLocked(reapingTuple *tuple, bktID int, bkt *bucket
 	// To maintain lock order, we can only reap both tuples if the tuple for the
 	// other direction appears later in the table.
 	if bktID > otherTupleBktID && replyTupleInserted {
-		return true
+		return
 	}
 
 	bkt.tuples.Remove(reapingTuple)
+	ct.count.Add(-1)
 
 	if !replyTupleInserted {
 		// The other tuple is the reply which has not yet been inserted.
-		return true
+		return
 	}
 
 	// Reap the other connection.
@@ -1102,8 +1430,6 @@ func (ct *ConnTrack) reapTupleLocked(reapingTuple *tuple, bktID int, bkt *bucket
 		otherTupleBkt.tuples.Remove(otherTuple)
 		otherTupleBkt.mu.Unlock()
 	}
-
-	return true
 }
 
 func (ct *ConnTrack) originalDst(epID TransportEndpointID, netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber) (tcpip.Address, uint16, tcpip.Error) {
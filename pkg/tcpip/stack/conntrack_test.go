@@ -16,6 +16,7 @@ package stack
 
 import (
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/bufferv2"
 	"gvisor.dev/gvisor/pkg/tcpip"
@@ -44,7 +45,7 @@ func TestReap(t *testing.T) {
 	// the connection won't be considered established. Thus the timeout for
 	// reaping is unestablishedTimeout.
 	pkt1 := genTCPPacket(genTCPOpts{})
-	pkt1.tuple = ct.getConnAndUpdate(pkt1, true /* skipChecksumValidation */)
+	pkt1.tuple, _ = ct.getConnAndUpdate(pkt1, true /* skipChecksumValidation */)
 	if pkt1.tuple.conn.handlePacket(pkt1, Output, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -54,7 +55,7 @@ func TestReap(t *testing.T) {
 	// lastUsed, but per #6748 didn't.
 	clock.Advance(unestablishedTimeout / 2)
 	pkt2 := genTCPPacket(genTCPOpts{})
-	pkt2.tuple = ct.getConnAndUpdate(pkt2, true /* skipChecksumValidation */)
+	pkt2.tuple, _ = ct.getConnAndUpdate(pkt2, true /* skipChecksumValidation */)
 	if pkt2.tuple.conn.handlePacket(pkt2, Output, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -173,7 +174,7 @@ func testWindowScaling(t *testing.T, windowSize uint16, synScale, synAckScale ui
 		srcPort:     &originatorPort,
 		dstPort:     &responderPort,
 	})
-	synPkt.tuple = ct.getConnAndUpdate(synPkt, true /* skipChecksumValidation */)
+	synPkt.tuple, _ = ct.getConnAndUpdate(synPkt, true /* skipChecksumValidation */)
 	if synPkt.tuple.conn.handlePacket(synPkt, Output, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -205,7 +206,7 @@ func testWindowScaling(t *testing.T, windowSize uint16, synScale, synAckScale ui
 		srcPort:     &responderPort,
 		dstPort:     &originatorPort,
 	})
-	synAckPkt.tuple = ct.getConnAndUpdate(synAckPkt, true /* skipChecksumValidation */)
+	synAckPkt.tuple, _ = ct.getConnAndUpdate(synAckPkt, true /* skipChecksumValidation */)
 	if synAckPkt.tuple.conn.handlePacket(synAckPkt, Prerouting, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -236,7 +237,7 @@ func testWindowScaling(t *testing.T, windowSize uint16, synScale, synAckScale ui
 		srcPort:    &originatorPort,
 		dstPort:    &responderPort,
 	})
-	ackPkt.tuple = ct.getConnAndUpdate(ackPkt, true /* skipChecksumValidation */)
+	ackPkt.tuple, _ = ct.getConnAndUpdate(ackPkt, true /* skipChecksumValidation */)
 	if ackPkt.tuple.conn.handlePacket(ackPkt, Output, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -266,6 +267,130 @@ func testWindowScaling(t *testing.T, windowSize uint16, synScale, synAckScale ui
 	ct.checkNumTuples(t, 0)
 }
 
+func TestTimeoutChangeAppliesOnRefresh(t *testing.T) {
+	clock := faketime.NewManualClock()
+	ct := ConnTrack{
+		clock: clock,
+	}
+	ct.init()
+
+	pkt := v6PacketBuffer()
+	if _, ok := ct.getConnAndUpdate(pkt, true /* skipChecksumValidation */); !ok {
+		t.Fatal("getConnAndUpdate() dropped the packet")
+	}
+	ct.checkNumTuples(t, 1)
+
+	// The connection keeps the timeout it had when it last saw a packet.
+	const timeout = 10 * time.Second
+	ct.SetTimeouts(ConnTrackTimeouts{UDP: timeout})
+	if got := ct.Timeouts().UDP; got != timeout {
+		t.Fatalf("got Timeouts().UDP = %s, want = %s", got, timeout)
+	}
+	clock.Advance(timeout + 1)
+	ct.reapEverything()
+	ct.checkNumTuples(t, 1)
+
+	// The next packet applies the new timeout.
+	pkt = v6PacketBuffer()
+	if _, ok := ct.getConnAndUpdate(pkt, true /* skipChecksumValidation */); !ok {
+		t.Fatal("getConnAndUpdate() dropped the packet")
+	}
+	clock.Advance(timeout / 2)
+	ct.reapEverything()
+	ct.checkNumTuples(t, 1)
+	clock.Advance(timeout)
+	ct.reapEverything()
+	ct.checkNumTuples(t, 0)
+}
+
+func TestConnTrackMax(t *testing.T) {
+	clock := faketime.NewManualClock()
+	ct := ConnTrack{
+		clock: clock,
+	}
+	ct.init()
+	ct.SetMax(1)
+
+	var (
+		originatorAddr = testutil.MustParse4("1.0.0.1")
+		responderAddr  = testutil.MustParse4("1.0.0.2")
+		responderPort  = uint16(6666)
+	)
+	syn := func(port uint16) (*tuple, bool) {
+		seq := uint32(10)
+		flags := header.TCPFlags(header.TCPFlagSyn)
+		return ct.getConnAndUpdate(genTCPPacket(genTCPOpts{
+			seqNum:  &seq,
+			flags:   &flags,
+			srcAddr: &originatorAddr,
+			dstAddr: &responderAddr,
+			srcPort: &port,
+			dstPort: &responderPort,
+		}), true /* skipChecksumValidation */)
+	}
+
+	// Establish a connection.
+	const establishedPort = 1000
+	tpl, ok := syn(establishedPort)
+	if !ok || tpl == nil {
+		t.Fatalf("got syn(%d) = (%v, %t), want a tracked connection", establishedPort, tpl, ok)
+	}
+	tpl.conn.finalize()
+	seq, ack := uint32(20), uint32(11)
+	flags := header.TCPFlags(header.TCPFlagSyn | header.TCPFlagAck)
+	port := uint16(establishedPort)
+	if _, ok := ct.getConnAndUpdate(genTCPPacket(genTCPOpts{
+		seqNum:  &seq,
+		ackNum:  &ack,
+		flags:   &flags,
+		srcAddr: &responderAddr,
+		dstAddr: &originatorAddr,
+		srcPort: &responderPort,
+		dstPort: &port,
+	}), true /* skipChecksumValidation */); !ok {
+		t.Fatal("getConnAndUpdate() dropped the SYN/ACK")
+	}
+	ct.checkNumTuples(t, 2)
+
+	// The table is full of established connections, so new connections must
+	// be refused.
+	if tpl, ok := syn(2000); ok || tpl != nil {
+		t.Fatalf("got syn(2000) = (%v, %t), want = (nil, false)", tpl, ok)
+	}
+	ct.checkNumTuples(t, 2)
+
+	// Expired connections are evicted.
+	clock.Advance(establishedTimeout + 1)
+	if tpl, ok := syn(3000); !ok || tpl == nil {
+		t.Fatalf("got syn(3000) = (%v, %t), want a tracked connection", tpl, ok)
+	}
+	ct.checkNumTuples(t, 1)
+
+	// Connections that are not established yet are evicted too.
+	if tpl, ok := syn(4000); !ok || tpl == nil {
+		t.Fatalf("got syn(4000) = (%v, %t), want a tracked connection", tpl, ok)
+	}
+	ct.checkNumTuples(t, 1)
+	if got := ct.Count(); got != 1 {
+		t.Errorf("got Count() = %d, want = 1", got)
+	}
+
+	entries := ct.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got len(Entries()) = %d, want = 1", len(entries))
+	}
+	e := entries[0]
+	if e.Original.SrcPort != 4000 || e.Reply.DstPort != 4000 {
+		t.Errorf("got entry tuples %+v, %+v, want port 4000", e.Original, e.Reply)
+	}
+	if e.State != "SYN_SENT" {
+		t.Errorf("got entry state %q, want = SYN_SENT", e.State)
+	}
+	if e.Timeout != unestablishedTimeout {
+		t.Errorf("got entry timeout %s, want = %s", e.Timeout, unestablishedTimeout)
+	}
+}
+
 type genTCPOpts struct {
 	windowSize  *uint16
 	windowScale uint8
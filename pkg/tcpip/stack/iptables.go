@@ -19,6 +19,7 @@ import (
 	"math/rand"
 	"time"
 
+	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
@@ -179,6 +180,7 @@ func DefaultTables(clock tcpip.Clock, rand *rand.Rand) *IPTables {
 			seed:  rand.Uint32(),
 			clock: clock,
 			rand:  rand,
+			max:   atomicbitops.FromInt64(DefaultConnTrackMax),
 		},
 	}
 }
@@ -213,6 +215,20 @@ func EmptyNATTable() Table {
 	}
 }
 
+// EmptyMangleTable returns a Table with no rules and the mangle table chains
+// mapped to HookUnset.
+func EmptyMangleTable() Table {
+	return Table{
+		Rules: []Rule{},
+		BuiltinChains: [NumHooks]int{
+			Forward: HookUnset,
+		},
+		Underflows: [NumHooks]int{
+			Forward: HookUnset,
+		},
+	}
+}
+
 // GetTable returns a table with the given id and IP version. It panics when an
 // invalid id is provided.
 func (it *IPTables) GetTable(id TableID, ipv6 bool) Table {
@@ -332,7 +348,11 @@ func (it *IPTables) CheckPrerouting(pkt PacketBufferPtr, addressEP AddressableEn
 		return true
 	}
 
-	pkt.tuple = it.connections.getConnAndUpdate(pkt, false /* skipChecksumValidation */)
+	t, ok := it.connections.getConnAndUpdate(pkt, false /* skipChecksumValidation */)
+	if !ok {
+		return false
+	}
+	pkt.tuple = t
 
 	for _, table := range tables {
 		if !table.fn(it, table.table, Prerouting, pkt, nil /* route */, addressEP, inNicName, "" /* outNicName */) {
@@ -448,7 +468,11 @@ func (it *IPTables) CheckOutput(pkt PacketBufferPtr, r *Route, outNicName string
 
 	// We don't need to validate the checksum in the Output path: we can assume
 	// we calculate it correctly, plus checksumming may be deferred due to GSO.
-	pkt.tuple = it.connections.getConnAndUpdate(pkt, true /* skipChecksumValidation */)
+	t, ok := it.connections.getConnAndUpdate(pkt, true /* skipChecksumValidation */)
+	if !ok {
+		return false
+	}
+	pkt.tuple = t
 
 	for _, table := range tables {
 		if !table.fn(it, table.table, Output, pkt, r, nil /* addressEP */, "" /* inNicName */, outNicName) {
@@ -575,7 +599,7 @@ func (it *IPTables) check(table Table, hook Hook, pkt PacketBufferPtr, r *Route,
 			return true
 		case RuleDrop:
 			return false
-		case RuleJump, RuleReturn:
+		case RuleJump, RuleReturn, RuleContinue:
 			panic("Underflows should only return RuleAccept or RuleDrop.")
 		default:
 			panic(fmt.Sprintf("Unknown verdict: %d", v))
@@ -624,6 +648,10 @@ func (it *IPTables) checkChain(hook Hook, pkt PacketBufferPtr, table Table, rule
 		case RuleReturn:
 			return chainReturn
 
+		case RuleContinue:
+			ruleIdx++
+			continue
+
 		case RuleJump:
 			// "Jumping" to the next rule just means we're
 			// continuing on down the list.
@@ -683,9 +711,17 @@ func (it *IPTables) checkRule(hook Hook, pkt PacketBufferPtr, table Table, ruleI
 	}
 
 	// All the matchers matched, so run the target.
+	if target, ok := rule.Target.(InterfaceTarget); ok {
+		return target.InterfaceAction(pkt, hook, r, addressEP, inNicName, outNicName)
+	}
 	return rule.Target.Action(pkt, hook, r, addressEP)
 }
 
+// ConnTrack returns the connection tracking table.
+func (it *IPTables) ConnTrack() *ConnTrack {
+	return &it.connections
+}
+
 // OriginalDst returns the original destination of redirected connections. It
 // returns an error if the connection doesn't exist or isn't redirected.
 func (it *IPTables) OriginalDst(epID TransportEndpointID, netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber) (tcpip.Address, uint16, tcpip.Error) {
@@ -371,6 +371,99 @@ func (mt *MasqueradeTarget) Action(pkt PacketBufferPtr, hook Hook, r *Route, add
 	return snatAction(pkt, hook, r, 0 /* port */, address)
 }
 
+// TPROXYTarget diverts TCP and UDP packets to the local transparent socket
+// bound to the given address and port without modifying them, so that the
+// socket observes their original destination. It also sets the packet's mark.
+type TPROXYTarget struct {
+	// Addr is the local address of the socket packets are diverted to. If
+	// empty, the primary address of the incoming interface is used.
+	//
+	// Immutable.
+	Addr tcpip.Address
+
+	// Port is the local port of the socket packets are diverted to. If zero,
+	// the packet's destination port is used.
+	//
+	// Immutable.
+	Port uint16
+
+	// Mark and MarkMask determine the packet's new mark, which is its old mark
+	// with the bits in MarkMask cleared and then xored with Mark.
+	//
+	// Immutable.
+	Mark     uint32
+	MarkMask uint32
+
+	// NetworkProtocol is the network protocol the target is used with.
+	//
+	// Immutable.
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+// Action implements Target.Action.
+func (tt *TPROXYTarget) Action(pkt PacketBufferPtr, hook Hook, _ *Route, addressEP AddressableEndpoint) (RuleVerdict, int) {
+	// Sanity check.
+	if tt.NetworkProtocol != pkt.NetworkProtocolNumber {
+		panic(fmt.Sprintf(
+			"TPROXYTarget.Action with NetworkProtocol %d called on packet with NetworkProtocolNumber %d",
+			tt.NetworkProtocol, pkt.NetworkProtocolNumber))
+	}
+
+	if hook != Prerouting {
+		panic(fmt.Sprintf("%s not supported for TPROXY", hook))
+	}
+
+	port := tt.Port
+	transportHeader := pkt.TransportHeader().Slice()
+	switch pkt.TransportProtocolNumber {
+	case header.TCPProtocolNumber:
+		if len(transportHeader) < header.TCPMinimumSize {
+			return RuleDrop, 0
+		}
+		if port == 0 {
+			port = header.TCP(transportHeader).DestinationPort()
+		}
+	case header.UDPProtocolNumber:
+		if len(transportHeader) < header.UDPMinimumSize {
+			return RuleDrop, 0
+		}
+		if port == 0 {
+			port = header.UDP(transportHeader).DestinationPort()
+		}
+	default:
+		return RuleDrop, 0
+	}
+
+	address := tt.Addr
+	if len(address) == 0 {
+		// addressEP is expected to be set for the prerouting hook.
+		address = addressEP.MainAddress().Address
+	}
+
+	pkt.mark = (pkt.mark &^ tt.MarkMask) ^ tt.Mark
+	pkt.tproxyDone = true
+	pkt.tproxyAddr = address
+	pkt.tproxyPort = port
+	pkt.deliverLocally = true
+	return RuleAccept, 0
+}
+
+// MarkTarget sets the packets' mark.
+type MarkTarget struct {
+	// Mark and Mask determine the packet's new mark, which is its old mark with
+	// the bits in Mask cleared and then xored with Mark.
+	//
+	// Immutable.
+	Mark uint32
+	Mask uint32
+}
+
+// Action implements Target.Action.
+func (mt *MarkTarget) Action(pkt PacketBufferPtr, _ Hook, _ *Route, _ AddressableEndpoint) (RuleVerdict, int) {
+	pkt.mark = (pkt.mark &^ mt.Mask) ^ mt.Mark
+	return RuleContinue, 0
+}
+
 func rewritePacket(n header.Network, t header.Transport, updateSRCFields, fullChecksum, updatePseudoHeader bool, newPortOrIdent uint16, newAddr tcpip.Address) {
 	switch t := t.(type) {
 	case header.ChecksummableTransport:
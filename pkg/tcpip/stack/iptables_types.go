@@ -75,6 +75,10 @@ const (
 
 	// RuleReturn indicates the packet should return to the previous chain.
 	RuleReturn
+
+	// RuleContinue indicates the packet should continue on to the next rule,
+	// as for targets that only modify packets.
+	RuleContinue
 )
 
 // IPTables holds all the tables for a netstack.
@@ -355,3 +359,14 @@ type Target interface {
 	// Jump, it also returns the index of the rule to jump to.
 	Action(PacketBufferPtr, Hook, *Route, AddressableEndpoint) (RuleVerdict, int)
 }
+
+// An InterfaceTarget is a Target whose action depends on the interfaces the
+// packet is handled at, such as one that evaluates an nftables rule. Rules
+// call InterfaceAction instead of Action on such targets.
+type InterfaceTarget interface {
+	Target
+
+	// InterfaceAction is like Action, but is also passed the names of the
+	// input and output interfaces, as Matcher.Match is.
+	InterfaceAction(pkt PacketBufferPtr, hook Hook, r *Route, addressEP AddressableEndpoint, inputInterfaceName, outputInterfaceName string) (RuleVerdict, int)
+}
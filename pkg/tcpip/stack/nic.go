@@ -138,6 +138,7 @@ func (*delegatingQueueingDiscipline) Close() {}
 
 // WritePacket passes the packet through to the underlying LinkWriter's WritePackets.
 func (qDisc *delegatingQueueingDiscipline) WritePacket(pkt PacketBufferPtr) tcpip.Error {
+	pkt.ReportTransmitted()
 	var pkts PacketBufferList
 	pkts.PushBack(pkt)
 	_, err := qDisc.LinkWriter.WritePackets(pkts)
@@ -553,6 +554,24 @@ func (n *nic) primaryAddresses() []tcpip.ProtocolAddress {
 	return addrs
 }
 
+// primaryAddressInfo returns information about the primary addresses
+// associated with this NIC, including tentative addresses.
+func (n *nic) primaryAddressInfo() []AddressInfo {
+	var infos []AddressInfo
+	for p, ep := range n.networkEndpoints {
+		addressableEndpoint, ok := ep.(AddressableEndpoint)
+		if !ok {
+			continue
+		}
+
+		for _, info := range addressableEndpoint.PrimaryAddressInfo() {
+			info.Protocol = p
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
 // PrimaryAddress implements NetworkInterface.
 func (n *nic) PrimaryAddress(proto tcpip.NetworkProtocolNumber) (tcpip.AddressWithPrefix, tcpip.Error) {
 	ep, ok := n.networkEndpoints[proto]
@@ -732,6 +751,7 @@ func (n *nic) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt Pac
 	}
 
 	pkt.RXTransportChecksumValidated = n.NetworkLinkEndpoint.Capabilities()&CapabilityRXChecksumOffload != 0
+	pkt.ReceivedAt = n.stack.Clock().Now()
 
 	networkEndpoint.HandlePacket(pkt)
 }
@@ -807,6 +827,12 @@ func (n *nic) DeliverTransportPacket(protocol tcpip.TransportProtocolNumber, pkt
 		return TransportPacketHandled
 	}
 
+	// Packets looped back by the network layer aren't dispatched by a link
+	// endpoint.
+	if pkt.ReceivedAt.IsZero() {
+		pkt.ReceivedAt = n.stack.Clock().Now()
+	}
+
 	srcPort, dstPort, err := transProto.ParsePorts(pkt.TransportHeader().Slice())
 	if err != nil {
 		n.stats.malformedL4RcvdPackets.Increment()
@@ -16,6 +16,7 @@ package stack
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/bufferv2"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -155,6 +156,22 @@ type packetBuffer struct {
 	// iptables NAT table.
 	dnatDone bool
 
+	// mark is the packet's netfilter mark, as set by the iptables MARK and
+	// TPROXY targets.
+	mark uint32
+
+	// tproxyDone indicates if the packet has been diverted by the iptables
+	// TPROXY target to the transparent socket bound to tproxyAddr and
+	// tproxyPort.
+	tproxyDone bool
+	tproxyAddr tcpip.Address
+	tproxyPort uint16
+
+	// deliverLocally indicates the packet is delivered locally even if its
+	// destination address isn't local, as for packets that were diverted by
+	// the TPROXY target or that belong to a transparent socket's connection.
+	deliverLocally bool
+
 	// PktType indicates the SockAddrLink.PacketType of the packet as defined in
 	// https://www.man7.org/linux/man-pages/man7/packet.7.html.
 	PktType tcpip.PacketType
@@ -169,6 +186,15 @@ type packetBuffer struct {
 	// NetworkPacketInfo holds an incoming packet's network-layer information.
 	NetworkPacketInfo NetworkPacketInfo
 
+	// ReceivedAt is the time at which an incoming packet was dispatched by
+	// the link endpoint.
+	ReceivedAt time.Time `state:".(int64)"`
+
+	// TXTimestamp, if not nil, is called when the packet is handed to the
+	// link endpoint, to report its SO_TIMESTAMPING software transmit
+	// timestamp. See ReportTransmitted.
+	TXTimestamp func(PacketBufferPtr) `state:"nosave"`
+
 	tuple *tuple
 
 	// onRelease is a function to be run when the packet buffer is no longer
@@ -317,6 +343,15 @@ func (pk PacketBufferPtr) ToView() *bufferv2.View {
 	return p
 }
 
+// ReportTransmitted must be called when pk is handed to the link endpoint. It
+// reports the SO_TIMESTAMPING transmit timestamp of pk, if one was requested.
+func (pk PacketBufferPtr) ReportTransmitted() {
+	if f := pk.TXTimestamp; f != nil {
+		pk.TXTimestamp = nil
+		f(pk)
+	}
+}
+
 func (pk PacketBufferPtr) headerOffset() int {
 	return pk.reserved - pk.pushed
 }
@@ -387,11 +422,17 @@ func (pk PacketBufferPtr) Clone() PacketBufferPtr {
 	newPk.NetworkProtocolNumber = pk.NetworkProtocolNumber
 	newPk.dnatDone = pk.dnatDone
 	newPk.snatDone = pk.snatDone
+	newPk.mark = pk.mark
+	newPk.tproxyDone = pk.tproxyDone
+	newPk.tproxyAddr = pk.tproxyAddr
+	newPk.tproxyPort = pk.tproxyPort
+	newPk.deliverLocally = pk.deliverLocally
 	newPk.TransportProtocolNumber = pk.TransportProtocolNumber
 	newPk.PktType = pk.PktType
 	newPk.NICID = pk.NICID
 	newPk.RXTransportChecksumValidated = pk.RXTransportChecksumValidated
 	newPk.NetworkPacketInfo = pk.NetworkPacketInfo
+	newPk.ReceivedAt = pk.ReceivedAt
 	newPk.tuple = pk.tuple
 	newPk.InitRefs()
 	return PacketBufferPtr{
@@ -399,6 +440,23 @@ func (pk PacketBufferPtr) Clone() PacketBufferPtr {
 	}
 }
 
+// Mark returns the packet's netfilter mark.
+func (pk PacketBufferPtr) Mark() uint32 {
+	return pk.mark
+}
+
+// DeliverLocally returns whether the packet must be delivered locally even if
+// its destination address isn't local.
+func (pk PacketBufferPtr) DeliverLocally() bool {
+	return pk.deliverLocally
+}
+
+// SetDeliverLocally marks the packet to be delivered locally even if its
+// destination address isn't local.
+func (pk PacketBufferPtr) SetDeliverLocally() {
+	pk.deliverLocally = true
+}
+
 // ReserveHeaderBytes prepends reserved space for headers at the front
 // of the underlying buf. Can only be called once per packet.
 func (pk PacketBufferPtr) ReserveHeaderBytes(reserved int) {
@@ -16,6 +16,7 @@ package stack
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/bufferv2"
@@ -448,6 +449,25 @@ func (state AddressAssignmentState) String() string {
 	}
 }
 
+// AddressInfo describes an address and its current properties.
+type AddressInfo struct {
+	// Protocol is the network protocol of the address. It is only set by
+	// Stack.PrimaryAddressInfo.
+	Protocol tcpip.NetworkProtocolNumber
+
+	// AddressWithPrefix is the address.
+	AddressWithPrefix tcpip.AddressWithPrefix
+
+	// ConfigType is the method used to add the address.
+	ConfigType AddressConfigType
+
+	// Lifetimes holds the address' lifetimes.
+	Lifetimes AddressLifetimes
+
+	// State is the address' assignment state.
+	State AddressAssignmentState
+}
+
 // AddressRemovalReason is the reason an address was removed.
 type AddressRemovalReason int
 
@@ -673,6 +693,10 @@ type AddressableEndpoint interface {
 
 	// PermanentAddresses returns all the permanent addresses.
 	PermanentAddresses() []tcpip.AddressWithPrefix
+
+	// PrimaryAddressInfo returns information about the primary addresses.
+	// Unlike PrimaryAddresses, tentative addresses are included.
+	PrimaryAddressInfo() []AddressInfo
 }
 
 // NDPEndpoint is a network endpoint that supports NDP.
@@ -1310,6 +1334,7 @@ const (
 	// Hardware GSO types:
 	GSOTCPv4
 	GSOTCPv6
+	GSOUDPL4
 
 	// GSOGvisor is used for gVisor GSO segments which have to be sent by
 	// endpoint.WritePackets.
@@ -1366,3 +1391,10 @@ type GSOEndpoint interface {
 // GvisorGSOMaxSize is a maximum allowed size of a software GSO segment.
 // This isn't a hard limit, because it is never set into packet headers.
 const GvisorGSOMaxSize = 1 << 16
+
+// LocalGSOMaxSize is the maximum size of a GSO segment written to a route that
+// delivers packets within the stack, e.g. over a loopback interface. Such
+// segments are never segmented, so unlike GvisorGSOMaxSize, this is a hard
+// limit: a segment with the largest possible transport header must still fit
+// in an IPv4 packet with the largest possible header.
+const LocalGSOMaxSize = math.MaxUint16 - header.IPv4MaximumHeaderSize
@@ -323,6 +323,13 @@ func (r *Route) HasHostGSOCapability() bool {
 	return false
 }
 
+// HasLocalGSOCapability returns true if packets written to the route are
+// delivered within the stack without being segmented, in which case segments
+// of up to LocalGSOMaxSize bytes may be written regardless of the route's MTU.
+func (r *Route) HasLocalGSOCapability() bool {
+	return r.local()
+}
+
 // HasSaveRestoreCapability returns true if the route supports save/restore.
 func (r *Route) HasSaveRestoreCapability() bool {
 	return r.outgoingNIC.NetworkLinkEndpoint.Capabilities()&CapabilitySaveRestore != 0
@@ -106,6 +106,10 @@ type Stack struct {
 	// invoked everytime they receive a TCP segment.
 	tcpProbeFunc atomic.Value // TCPProbeFunc
 
+	// If not nil, tcpConnectHook is invoked before TCP endpoints send a SYN
+	// to connect to a peer.
+	tcpConnectHook atomic.Value // TCPConnectHook
+
 	// clock is used to generate user-visible times.
 	clock tcpip.Clock
 
@@ -120,6 +124,10 @@ type Stack struct {
 	// stack is being restored.
 	resumableEndpoints []ResumableEndpoint
 
+	// restoreSubnetRewrites are applied to the local addresses of endpoints
+	// being resumed. It is protected by mu.
+	restoreSubnetRewrites []SubnetRewrite
+
 	// icmpRateLimiter is a global rate limiter for all ICMP messages generated
 	// by the stack.
 	icmpRateLimiter *ICMPRateLimiter
@@ -748,6 +756,17 @@ func (s *Stack) RemoveRoutes(match func(tcpip.Route) bool) {
 	s.routeTable = filteredRoutes
 }
 
+// UpdateRouteTable atomically replaces the route table with the table returned
+// by update, which is called with a copy of the current route table. If update
+// returns false, the route table is left unchanged.
+func (s *Stack) UpdateRouteTable(update func(table []tcpip.Route) ([]tcpip.Route, bool)) {
+	s.routeMu.Lock()
+	defer s.routeMu.Unlock()
+	if table, ok := update(append([]tcpip.Route(nil), s.routeTable...)); ok {
+		s.routeTable = table
+	}
+}
+
 // NewEndpoint creates a new transport layer endpoint of the given protocol.
 func (s *Stack) NewEndpoint(transport tcpip.TransportProtocolNumber, network tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
 	t, ok := s.transportProtocols[transport]
@@ -1124,6 +1143,19 @@ func (s *Stack) AllAddresses() map[tcpip.NICID][]tcpip.ProtocolAddress {
 	return nics
 }
 
+// PrimaryAddressInfo returns a map of NICIDs to information about their
+// primary addresses, including tentative addresses.
+func (s *Stack) PrimaryAddressInfo() map[tcpip.NICID][]AddressInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nics := make(map[tcpip.NICID][]AddressInfo)
+	for id, nic := range s.nics {
+		nics[id] = nic.primaryAddressInfo()
+	}
+	return nics
+}
+
 // GetMainNICAddress returns the first non-deprecated primary address and prefix
 // for the given NIC and protocol. If no non-deprecated primary addresses exist,
 // a deprecated address will be returned. If no deprecated addresses exist, the
@@ -1420,6 +1452,41 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 	return nil, &tcpip.ErrNetworkUnreachable{}
 }
 
+// FindRouteThroughNIC is like FindRoute, but only returns routes that leave
+// through the NIC with the given ID (or deliver packets locally), as required
+// for endpoints bound to a device with SO_BINDTODEVICE. Unlike FindRoute, it
+// never returns a route that uses an address assigned to id but leaves through
+// another NIC when forwarding is enabled. If id is 0, it is equivalent to
+// FindRoute.
+func (s *Stack) FindRouteThroughNIC(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool) (*Route, tcpip.Error) {
+	r, err := s.FindRoute(id, localAddr, remoteAddr, netProto, multicastLoop)
+	if err != nil {
+		return nil, err
+	}
+	if id != 0 && r.NICID() != id && !r.local() {
+		r.Release()
+		return nil, &tcpip.ErrHostUnreachable{}
+	}
+	return r, nil
+}
+
+// FindTransparentRoute is like FindRoute, but permits localAddr to be an
+// address that isn't assigned to the stack, as for sockets with IP_TRANSPARENT
+// set, which may reply on behalf of the original destination of connections
+// diverted to them by the TPROXY target. Such routes otherwise behave like the
+// route FindRoute selects for remoteAddr without a local address.
+func (s *Stack) FindTransparentRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool) (*Route, tcpip.Error) {
+	if len(localAddr) == 0 || s.CheckLocalAddress(id, netProto, localAddr) != 0 {
+		return s.FindRoute(id, localAddr, remoteAddr, netProto, multicastLoop)
+	}
+	r, err := s.FindRoute(id, "" /* localAddr */, remoteAddr, netProto, multicastLoop)
+	if err != nil {
+		return nil, err
+	}
+	r.routeInfo.LocalAddress = localAddr
+	return r, nil
+}
+
 // CheckNetworkProtocol checks if a given network protocol is enabled in the
 // stack.
 func (s *Stack) CheckNetworkProtocol(protocol tcpip.NetworkProtocolNumber) bool {
@@ -1638,6 +1705,18 @@ func (s *Stack) FindTransportEndpoint(netProto tcpip.NetworkProtocolNumber, tran
 	return s.demux.findTransportEndpoint(netProto, transProto, id, nicID)
 }
 
+// FindSocket returns the socket a packet with the given id would be delivered
+// to, and whether the socket has IP_TRANSPARENT set, as for the iptables
+// socket match. Sockets bound to the wildcard address are only considered if
+// wildcard is true.
+func (s *Stack) FindSocket(netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, id TransportEndpointID, nicID tcpip.NICID, wildcard bool) (TransportEndpoint, bool) {
+	ep := s.demux.findSocket(netProto, transProto, id, nicID, wildcard)
+	if ep == nil {
+		return nil, false
+	}
+	return ep, isTransparent(ep)
+}
+
 // RegisterRawTransportEndpoint registers the given endpoint with the stack
 // transport dispatcher. Received packets that match the provided transport
 // protocol will be delivered to the given endpoint.
@@ -1659,6 +1738,59 @@ func (s *Stack) RegisterRestoredEndpoint(e ResumableEndpoint) {
 	s.mu.Unlock()
 }
 
+// SubnetRewrite maps addresses in subnet Old to the addresses with the same
+// host bits in subnet New. Old and New must have the same prefix length.
+type SubnetRewrite struct {
+	Old tcpip.Subnet
+	New tcpip.Subnet
+}
+
+// apply returns the address that addr maps to, and whether addr is in r.Old.
+func (r *SubnetRewrite) apply(addr tcpip.Address) (tcpip.Address, bool) {
+	if len(addr) != len(r.Old.ID()) || !r.Old.Contains(addr) {
+		return addr, false
+	}
+	mask := r.New.Mask()
+	id := r.New.ID()
+	b := []byte(addr)
+	for i := range b {
+		b[i] = (b[i] &^ mask[i]) | id[i]
+	}
+	return tcpip.Address(b), true
+}
+
+// SetRestoreSubnetRewrites sets the rewrites applied to the local addresses of
+// endpoints that are restored on this stack. This allows connections to keep
+// working when the stack is restored with addresses in different subnets than
+// the ones it was saved with.
+//
+// Preconditions: Resume has not been called yet.
+func (s *Stack) SetRestoreSubnetRewrites(rewrites []SubnetRewrite) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restoreSubnetRewrites = rewrites
+}
+
+// RewriteRestoredAddress returns the address that addr, the local address of
+// an endpoint that was saved, maps to on this stack. If addr doesn't match any
+// of the stack's restore subnet rewrites, it is returned unchanged. The IPv4
+// address embedded in an IPv4-mapped IPv6 address is rewritten like an IPv4
+// address.
+func (s *Stack) RewriteRestoredAddress(addr tcpip.Address) tcpip.Address {
+	if header.IsV4MappedAddress(addr) {
+		const prefixLen = header.IPv6AddressSize - header.IPv4AddressSize
+		return addr[:prefixLen] + s.RewriteRestoredAddress(addr[prefixLen:])
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range s.restoreSubnetRewrites {
+		if newAddr, ok := s.restoreSubnetRewrites[i].apply(addr); ok {
+			return newAddr
+		}
+	}
+	return addr
+}
+
 // RegisteredEndpoints returns all endpoints which are currently registered.
 func (s *Stack) RegisteredEndpoints() []TransportEndpoint {
 	s.mu.Lock()
@@ -1913,6 +2045,24 @@ func (s *Stack) RemoveTCPProbe() {
 	s.tcpProbeFunc.Store(TCPProbeFunc(nil))
 }
 
+// SetTCPConnectHook installs a hook that decides whether TCP endpoints are
+// allowed to connect, replacing any previous hook. A nil hook allows all
+// connections.
+func (s *Stack) SetTCPConnectHook(hook TCPConnectHook) {
+	// This must be a TCPConnectHook because atomic.Value.Store(nil) panics.
+	s.tcpConnectHook.Store(hook)
+}
+
+// GetTCPConnectHook returns the hook installed with SetTCPConnectHook, or nil
+// if there is none.
+func (s *Stack) GetTCPConnectHook() TCPConnectHook {
+	h := s.tcpConnectHook.Load()
+	if h == nil {
+		return nil
+	}
+	return h.(TCPConnectHook)
+}
+
 // JoinGroup joins the given multicast group on the given NIC.
 func (s *Stack) JoinGroup(protocol tcpip.NetworkProtocolNumber, nicID tcpip.NICID, multicastAddr tcpip.Address) tcpip.Error {
 	s.mu.RLock()
@@ -4452,6 +4452,74 @@ func TestRemoveRoutes(t *testing.T) {
 	}
 }
 
+// TestUpdateRouteTable tests Stack.UpdateRouteTable
+func TestUpdateRouteTable(t *testing.T) {
+	s := stack.New(stack.Options{})
+
+	subnet1, err := tcpip.NewSubnet("\x01", "\x01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subnet2, err := tcpip.NewSubnet("\x02", "\x02")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route1 := tcpip.Route{Destination: subnet1, Gateway: "\x00", NIC: 1}
+	route2 := tcpip.Route{Destination: subnet2, Gateway: "\x00", NIC: 1, Metric: 100}
+	s.SetRouteTable([]tcpip.Route{route1})
+
+	// Insert a route before the existing one.
+	s.UpdateRouteTable(func(table []tcpip.Route) ([]tcpip.Route, bool) {
+		return append([]tcpip.Route{route2}, table...), true
+	})
+	// A rejected update doesn't change the route table.
+	s.UpdateRouteTable(func(table []tcpip.Route) ([]tcpip.Route, bool) {
+		return nil, false
+	})
+
+	expected := []tcpip.Route{route2, route1}
+	rt := s.GetRouteTable()
+	if got, want := len(rt), len(expected); got != want {
+		t.Fatalf("Unexpected route table length got = %d, want = %d", got, want)
+	}
+	for i, route := range rt {
+		if got, want := route, expected[i]; got != want {
+			t.Fatalf("Unexpected route got = %#v, want = %#v", got, want)
+		}
+	}
+}
+
+func TestRewriteRestoredAddress(t *testing.T) {
+	s := stack.New(stack.Options{})
+
+	oldSubnet, err := tcpip.NewSubnet(testutil.MustParse4("10.0.0.0"), tcpip.AddressMask(testutil.MustParse4("255.255.255.0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSubnet, err := tcpip.NewSubnet(testutil.MustParse4("10.1.2.0"), tcpip.AddressMask(testutil.MustParse4("255.255.255.0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetRestoreSubnetRewrites([]stack.SubnetRewrite{{Old: oldSubnet, New: newSubnet}})
+
+	for _, test := range []struct {
+		addr tcpip.Address
+		want tcpip.Address
+	}{
+		{addr: testutil.MustParse4("10.0.0.5"), want: testutil.MustParse4("10.1.2.5")},
+		{addr: testutil.MustParse4("10.0.1.5"), want: testutil.MustParse4("10.0.1.5")},
+		{addr: testutil.MustParse4("127.0.0.1"), want: testutil.MustParse4("127.0.0.1")},
+		{addr: testutil.MustParse6("a00::5"), want: testutil.MustParse6("a00::5")},
+		{addr: testutil.MustParse6("::ffff:10.0.0.5"), want: testutil.MustParse6("::ffff:10.1.2.5")},
+	} {
+		if got := s.RewriteRestoredAddress(test.addr); got != test.want {
+			t.Errorf("RewriteRestoredAddress(%s) = %s, want %s", test.addr, got, test.want)
+		}
+	}
+}
+
 func TestFindRouteWithForwarding(t *testing.T) {
 	const (
 		nicID1 = 1
@@ -4832,6 +4900,86 @@ func TestFindRouteWithForwarding(t *testing.T) {
 	}
 }
 
+func TestFindRouteThroughNIC(t *testing.T) {
+	const (
+		nicID1 = 1
+		nicID2 = 2
+
+		nic1Addr   = tcpip.Address("\x01")
+		nic2Addr   = tcpip.Address("\x02")
+		remoteAddr = tcpip.Address("\x03")
+	)
+
+	tests := []struct {
+		name              string
+		forwardingEnabled bool
+		nicID             tcpip.NICID
+		wantErr           tcpip.Error
+	}{
+		{
+			name:    "no NIC",
+			nicID:   0,
+			wantErr: nil,
+		},
+		{
+			name:    "NIC with route",
+			nicID:   nicID2,
+			wantErr: nil,
+		},
+		{
+			name:    "NIC without route",
+			nicID:   nicID1,
+			wantErr: &tcpip.ErrHostUnreachable{},
+		},
+		{
+			// FindRoute would return a route leaving through NIC2 with NIC1's
+			// address.
+			name:              "NIC without route and forwarding enabled",
+			forwardingEnabled: true,
+			nicID:             nicID1,
+			wantErr:           &tcpip.ErrHostUnreachable{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols: []stack.NetworkProtocolFactory{fakeNetFactory},
+			})
+			for _, nic := range []struct {
+				id   tcpip.NICID
+				addr tcpip.Address
+			}{{nicID1, nic1Addr}, {nicID2, nic2Addr}} {
+				if err := s.CreateNIC(nic.id, channel.New(1, defaultMTU, "")); err != nil {
+					t.Fatalf("CreateNIC(%d, _): %s", nic.id, err)
+				}
+				protocolAddr := tcpip.ProtocolAddress{
+					Protocol:          fakeNetNumber,
+					AddressWithPrefix: tcpip.AddressWithPrefix{Address: nic.addr, PrefixLen: fakeDefaultPrefixLen},
+				}
+				if err := s.AddProtocolAddress(nic.id, protocolAddr, stack.AddressProperties{}); err != nil {
+					t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nic.id, protocolAddr, err)
+				}
+			}
+			if err := s.SetForwardingDefaultAndAllNICs(fakeNetNumber, test.forwardingEnabled); err != nil {
+				t.Fatalf("SetForwardingDefaultAndAllNICs(%d, %t): %s", fakeNetNumber, test.forwardingEnabled, err)
+			}
+			s.SetRouteTable([]tcpip.Route{{Destination: remoteAddr.WithPrefix().Subnet(), NIC: nicID2}})
+
+			r, err := s.FindRouteThroughNIC(test.nicID, "" /* localAddr */, remoteAddr, fakeNetNumber, false /* multicastLoop */)
+			if err == nil {
+				defer r.Release()
+			}
+			if diff := cmp.Diff(test.wantErr, err); diff != "" {
+				t.Fatalf("unexpected error from FindRouteThroughNIC(%d, '', %s, %d, false), (-want, +got):\n%s", test.nicID, remoteAddr, fakeNetNumber, diff)
+			}
+			if err == nil && r.NICID() != nicID2 {
+				t.Errorf("got r.NICID() = %d, want = %d", r.NICID(), nicID2)
+			}
+		})
+	}
+}
+
 func TestAddMulticastRoute(t *testing.T) {
 	const (
 		incomingNICID = 1
@@ -28,6 +28,55 @@ import (
 // passed to stack.AddTCPProbe.
 type TCPProbeFunc func(s *TCPEndpointState)
 
+// TCPConnectVerdict is the decision of a TCPConnectHook.
+type TCPConnectVerdict int
+
+const (
+	// TCPConnectAllow lets the connection proceed.
+	TCPConnectAllow TCPConnectVerdict = iota
+
+	// TCPConnectDeny fails the connection with ErrConnectionRefused.
+	TCPConnectDeny
+
+	// TCPConnectRedirect connects to a different destination instead.
+	TCPConnectRedirect
+)
+
+// TCPConnectRequest describes an active TCP open that is about to send its SYN.
+type TCPConnectRequest struct {
+	// NetProto is the network protocol of the connection.
+	NetProto tcpip.NetworkProtocolNumber
+
+	// NICID is the NIC that the connection is routed through.
+	NICID tcpip.NICID
+
+	// ID identifies the connection. ID.LocalPort is zero if the endpoint
+	// isn't bound yet, in which case an ephemeral port is picked once the
+	// hook allows the connection.
+	ID TransportEndpointID
+
+	// Owner is the owner of the endpoint, as set by Endpoint.SetOwner. It may
+	// be nil.
+	Owner tcpip.PacketOwner
+}
+
+// TCPConnectDecision is the result of a TCPConnectHook.
+type TCPConnectDecision struct {
+	// Verdict is the decision about the connection.
+	Verdict TCPConnectVerdict
+
+	// Redirect is the destination that the connection is made to instead if
+	// Verdict is TCPConnectRedirect. Its address must be of the same network
+	// protocol as the original destination, and its NIC is ignored.
+	Redirect tcpip.FullAddress
+}
+
+// TCPConnectHook is the function type of hooks passed to
+// Stack.SetTCPConnectHook. It's invoked on the goroutine that connects the
+// endpoint, while only the endpoint is locked, so it may block briefly without
+// holding up other endpoints.
+type TCPConnectHook func(req TCPConnectRequest) TCPConnectDecision
+
 // TCPCubicState is used to hold a copy of the internal cubic state when the
 // TCPProbeFunc is invoked.
 //
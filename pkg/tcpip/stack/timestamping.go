@@ -0,0 +1,37 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// NewTXTimestamp returns a PacketBuffer.TXTimestamp function that queues the
+// packet's SO_TIMESTAMPING software transmit timestamp, identified by key,
+// onto the error queue of ops and notifies waiterQueue.
+func NewTXTimestamp(clock tcpip.Clock, ops *tcpip.SocketOptions, key uint32, waiterQueue *waiter.Queue) func(PacketBufferPtr) {
+	return func(pkt PacketBufferPtr) {
+		now := clock.Now()
+		var payload *bufferv2.View
+		if ops.GetTimestamping()&tcpip.TimestampingOptTSOnly == 0 {
+			payload = pkt.ToView()
+		}
+		if ops.QueueTXTimestamp(key, now, pkt.NetworkProtocolNumber, payload) {
+			waiterQueue.Notify(waiter.EventErr)
+		}
+	}
+}
@@ -157,6 +157,12 @@ func (epsByNIC *endpointsByNIC) transportEndpoints() []TransportEndpoint {
 // endpoint. It returns false if the packet could not be matched to any
 // transport endpoint, true otherwise.
 func (epsByNIC *endpointsByNIC) handlePacket(id TransportEndpointID, pkt PacketBufferPtr) bool {
+	return epsByNIC.handlePacketFiltered(id, pkt, false /* transparentOnly */)
+}
+
+// handlePacketFiltered is like handlePacket, but if transparentOnly is true,
+// the packet is only delivered to an endpoint with IP_TRANSPARENT set.
+func (epsByNIC *endpointsByNIC) handlePacketFiltered(id TransportEndpointID, pkt PacketBufferPtr, transparentOnly bool) bool {
 	epsByNIC.mu.RLock()
 
 	mpep, ok := epsByNIC.endpoints[pkt.NICID]
@@ -176,6 +182,10 @@ func (epsByNIC *endpointsByNIC) handlePacket(id TransportEndpointID, pkt PacketB
 	}
 	// multiPortEndpoints are guaranteed to have at least one element.
 	transEP := mpep.selectEndpoint(id, epsByNIC.seed)
+	if transparentOnly && !isTransparent(transEP) {
+		epsByNIC.mu.RUnlock()
+		return false
+	}
 	if queuedProtocol, mustQueue := mpep.demux.queuedProtocols[protocolIDs{mpep.netProto, mpep.transProto}]; mustQueue {
 		queuedProtocol.QueuePacket(transEP, id, pkt)
 		epsByNIC.mu.RUnlock()
@@ -466,9 +476,20 @@ func (ep *multiPortEndpoint) unregisterEndpoint(t TransportEndpoint, flags ports
 
 	for i, endpoint := range ep.endpoints {
 		if endpoint == t {
-			copy(ep.endpoints[i:], ep.endpoints[i+1:])
-			ep.endpoints[len(ep.endpoints)-1] = nil
-			ep.endpoints = ep.endpoints[:len(ep.endpoints)-1]
+			last := len(ep.endpoints) - 1
+			if ep.flags.SharedFlags().ToFlags().Effective().LoadBalanced {
+				// Like Linux, fill the vacated slot with the most recently
+				// bound endpoint. Removing a member never makes a load
+				// balanced group MostRecent, so the bind order need not be
+				// preserved.
+				//
+				// Compare net/core/sock_reuseport.c:reuseport_detach_sock().
+				ep.endpoints[i] = ep.endpoints[last]
+			} else {
+				copy(ep.endpoints[i:], ep.endpoints[i+1:])
+			}
+			ep.endpoints[last] = nil
+			ep.endpoints = ep.endpoints[:last]
 
 			ep.flags.DropRef(flags.Bits() & ports.MultiBindFlagMask)
 			break
@@ -586,6 +607,10 @@ func (d *transportDemuxer) deliverPacket(protocol tcpip.TransportProtocolNumber,
 		return true
 	}
 
+	if pkt.tproxyDone {
+		return d.deliverTProxyPacket(eps, pkt, id)
+	}
+
 	eps.mu.RLock()
 	ep := eps.findEndpointLocked(id)
 	eps.mu.RUnlock()
@@ -598,6 +623,27 @@ func (d *transportDemuxer) deliverPacket(protocol tcpip.TransportProtocolNumber,
 	return ep.handlePacket(id, pkt)
 }
 
+// deliverTProxyPacket delivers a packet diverted by the TPROXY target. As in
+// net/netfilter/xt_TPROXY.c, packets that belong to an existing connection
+// are delivered to it, and other packets are delivered to the transparent
+// socket bound to the address and port they were diverted to. Packets are
+// dropped if there is no such socket.
+func (d *transportDemuxer) deliverTProxyPacket(eps *transportEndpoints, pkt PacketBufferPtr, id TransportEndpointID) bool {
+	eps.mu.RLock()
+	epsByNIC, established := eps.endpoints[id]
+	if !established {
+		tid := id
+		tid.LocalAddress = pkt.tproxyAddr
+		tid.LocalPort = pkt.tproxyPort
+		epsByNIC = eps.findEndpointLocked(tid)
+	}
+	eps.mu.RUnlock()
+	if epsByNIC != nil {
+		epsByNIC.handlePacketFiltered(id, pkt, !established /* transparentOnly */)
+	}
+	return true
+}
+
 // deliverRawPacket attempts to deliver the given packet and returns whether it
 // was delivered successfully.
 func (d *transportDemuxer) deliverRawPacket(protocol tcpip.TransportProtocolNumber, pkt PacketBufferPtr) bool {
@@ -681,6 +727,50 @@ func (d *transportDemuxer) findTransportEndpoint(netProto tcpip.NetworkProtocolN
 	return ep
 }
 
+// findSocket is like findTransportEndpoint, but if wildcard is false, it
+// ignores endpoints bound to the wildcard address.
+func (d *transportDemuxer) findSocket(netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, id TransportEndpointID, nicID tcpip.NICID, wildcard bool) TransportEndpoint {
+	if wildcard {
+		return d.findTransportEndpoint(netProto, transProto, id, nicID)
+	}
+
+	eps, ok := d.protocol[protocolIDs{netProto, transProto}]
+	if !ok {
+		return nil
+	}
+
+	eps.mu.RLock()
+	epsByNIC, ok := eps.endpoints[id]
+	if !ok {
+		epsByNIC, ok = eps.endpoints[TransportEndpointID{LocalPort: id.LocalPort, LocalAddress: id.LocalAddress}]
+	}
+	if !ok {
+		eps.mu.RUnlock()
+		return nil
+	}
+
+	epsByNIC.mu.RLock()
+	eps.mu.RUnlock()
+
+	mpep, ok := epsByNIC.endpoints[nicID]
+	if !ok {
+		if mpep, ok = epsByNIC.endpoints[0]; !ok {
+			epsByNIC.mu.RUnlock()
+			return nil
+		}
+	}
+
+	ep := mpep.selectEndpoint(id, epsByNIC.seed)
+	epsByNIC.mu.RUnlock()
+	return ep
+}
+
+// isTransparent returns whether ep has IP_TRANSPARENT set.
+func isTransparent(ep TransportEndpoint) bool {
+	so, ok := ep.(interface{ SocketOptions() *tcpip.SocketOptions })
+	return ok && so.SocketOptions().GetTransparent()
+}
+
 // registerRawEndpoint registers the given endpoint with the dispatcher such
 // that packets of the appropriate protocol are delivered to it. A single
 // packet can be sent to one or more raw endpoints along with a non-raw
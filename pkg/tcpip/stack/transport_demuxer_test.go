@@ -18,6 +18,7 @@ import (
 	"io/ioutil"
 	"math"
 	"math/rand"
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -453,3 +454,91 @@ func TestBindToDeviceDistribution(t *testing.T) {
 		}
 	}
 }
+
+func TestReusePortRebalanceOnClose(t *testing.T) {
+	const (
+		nendpoints = 4
+		nports     = 500
+	)
+	c := newDualTestContextMultiNIC(t, defaultMTU, []tcpip.NICID{1})
+
+	eps := make(map[tcpip.Endpoint]int)
+	pollChannel := make(chan tcpip.Endpoint)
+	var closed tcpip.Endpoint
+	for i := 0; i < nendpoints; i++ {
+		wq := waiter.Queue{}
+		we, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+		wq.EventRegister(&we)
+		t.Cleanup(func() {
+			wq.EventUnregister(&we)
+			close(ch)
+		})
+
+		ep, err := c.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+		if err != nil {
+			t.Fatalf("NewEndpoint failed: %s", err)
+		}
+		eps[ep] = i
+		if i == 1 {
+			closed = ep
+		} else {
+			t.Cleanup(ep.Close)
+		}
+
+		go func(ep tcpip.Endpoint) {
+			for range ch {
+				pollChannel <- ep
+			}
+		}(ep)
+
+		ep.SocketOptions().SetReusePort(true)
+		if err := ep.Bind(tcpip.FullAddress{Addr: testDstAddrV4, Port: testDstPort}); err != nil {
+			t.Fatalf("ep.Bind(...) on endpoint %d failed: %s", i, err)
+		}
+	}
+
+	// sendAll sends one packet from each source port and returns the endpoint
+	// that received each of them.
+	sendAll := func() map[uint16]tcpip.Endpoint {
+		got := make(map[uint16]tcpip.Endpoint)
+		for port := uint16(0); port < nports; port++ {
+			c.sendV4Packet(newPayload(), &headers{
+				srcPort: testSrcPort + port,
+				dstPort: testDstPort,
+			}, 1)
+
+			ep := <-pollChannel
+			if _, err := ep.Read(ioutil.Discard, tcpip.ReadOptions{}); err != nil {
+				t.Fatalf("Read on endpoint %d failed: %s", eps[ep], err)
+			}
+			got[port] = ep
+		}
+		return got
+	}
+
+	sendAll()
+	closed.Close()
+	after := sendAll()
+	if again := sendAll(); !reflect.DeepEqual(after, again) {
+		t.Errorf("flows were not stable after endpoint %d was closed", eps[closed])
+	}
+
+	stats := make(map[tcpip.Endpoint]int)
+	for port, ep := range after {
+		if ep == closed {
+			t.Fatalf("packet sent on port %d was delivered to closed endpoint %d", port, eps[closed])
+		}
+		stats[ep]++
+	}
+	for ep, i := range eps {
+		if ep == closed {
+			continue
+		}
+		if stats[ep] == 0 {
+			t.Errorf("endpoint %d received no packets after endpoint %d was closed", i, eps[closed])
+		}
+	}
+	if got := c.s.Stats().UDP.UnknownPortErrors.Value(); got != 0 {
+		t.Errorf("got UnknownPortErrors = %d, want 0", got)
+	}
+}
@@ -454,6 +454,19 @@ type SendableControlMessages struct {
 
 	// IPv6PacketInfo holds interface and address data on an incoming packet.
 	IPv6PacketInfo IPv6PacketInfo
+
+	// HasGSOSize indicates whether GSOSize is valid/set.
+	HasGSOSize bool
+
+	// GSOSize is the size of the UDP datagrams that the payload is segmented
+	// into; see UDPSegmentOption.
+	GSOSize uint16
+	// HasSCTPSndRcvInfo indicates whether SCTPSndRcvInfo is valid/set.
+	HasSCTPSndRcvInfo bool
+
+	// SCTPSndRcvInfo holds the SCTP stream and flags to send the message
+	// with.
+	SCTPSndRcvInfo SCTPSndRcvInfo
 }
 
 // ReceivableControlMessages contains socket control messages that can be
@@ -518,6 +531,19 @@ type ReceivableControlMessages struct {
 	// and port of the incoming packet.
 	OriginalDstAddress FullAddress
 
+	// HasGROSize indicates whether GROSize is valid/set.
+	HasGROSize bool
+
+	// GROSize is the size of each of the UDP datagrams that were coalesced
+	// into the payload, other than the last one, which may be shorter.
+	GROSize uint16
+
+	// HasSCTPSndRcvInfo indicates whether SCTPSndRcvInfo is valid/set.
+	HasSCTPSndRcvInfo bool
+
+	// SCTPSndRcvInfo describes the SCTP message the read data belongs to.
+	SCTPSndRcvInfo SCTPSndRcvInfo
+
 	// SockErr is the dequeued socket error on recvmsg(MSG_ERRQUEUE).
 	SockErr *SockError
 }
@@ -563,6 +589,46 @@ type ReadResult struct {
 	// LinkPacketInfo is the link-layer information of the received packet if
 	// ReadOptions.NeedLinkPacketInfo is true.
 	LinkPacketInfo LinkPacketInfo
+
+	// EndOfRecord is true if the read data completes a record, for protocols
+	// that preserve record boundaries on stream sockets (e.g. SCTP).
+	EndOfRecord bool
+}
+
+// SCTPSndRcvInfo holds the per-message SCTP information exchanged through the
+// SCTP_SNDRCV control message.
+//
+// +stateify savable
+type SCTPSndRcvInfo struct {
+	// Stream is the SCTP stream the message is sent or received on.
+	Stream uint16
+
+	// SSN is the stream sequence number of a received ordered message.
+	SSN uint16
+
+	// Unordered indicates that the message is delivered without regard to
+	// its stream sequence number.
+	Unordered bool
+
+	// PPID is the payload protocol identifier of the message, in host byte
+	// order.
+	PPID uint32
+
+	// TSN is the transmission sequence number of the first fragment of a
+	// received message.
+	TSN uint32
+
+	// CumTSN is the cumulative TSN the association had acknowledged when a
+	// received message was delivered.
+	CumTSN uint32
+
+	// Abort requests that the association be aborted, carrying the message
+	// in the ABORT chunk's user-initiated abort cause.
+	Abort bool
+
+	// EOF requests graceful shutdown of the association once the message
+	// has been sent.
+	EOF bool
 }
 
 // Endpoint is the interface implemented by transport protocols (e.g., tcp, udp)
@@ -753,6 +819,17 @@ type WriteOptions struct {
 
 	// ControlMessages contains optional overrides used when writing a packet.
 	ControlMessages SendableControlMessages
+
+	// ZeroCopy indicates that the write is part of the MSG_ZEROCOPY send with
+	// notification ID ZeroCopyID; see SocketOptions.StartZeroCopySend. It is
+	// only supported by TCP endpoints.
+	ZeroCopy   bool
+	ZeroCopyID uint32
+
+	// FastOpen has the same semantics as Linux's MSG_FASTOPEN: if the
+	// endpoint isn't connected, it is connected to To and as much data as
+	// possible is sent in the SYN. It is only supported by TCP endpoints.
+	FastOpen bool
 }
 
 // SockOptInt represents socket options which values have the int type.
@@ -797,6 +874,12 @@ const (
 	// number of unread bytes in the output buffer should be returned.
 	SendQueueSizeOption
 
+	// ReceiveBufferUsedOption is used in GetSockOptInt to specify that the
+	// total number of bytes queued in the input buffer of a datagram
+	// endpoint should be returned, rather than only the size of the next
+	// datagram.
+	ReceiveBufferUsedOption
+
 	// IPv4TTLOption is used by SetSockOptInt/GetSockOptInt to control the default
 	// TTL value for unicast messages.
 	//
@@ -824,9 +907,32 @@ const (
 	// NOTE: This option is currently only stubed out and is a no-op
 	TCPWindowClampOption
 
+	// TCPFastOpenQueueLenOption is used by SetSockOptInt/GetSockOptInt to
+	// enable TCP Fast Open on a listening endpoint. Its value is the maximum
+	// number of connections that may have been accepted with data in their
+	// SYN while their handshake is still in progress. Zero disables TCP Fast
+	// Open.
+	TCPFastOpenQueueLenOption
+
+	// TCPFastOpenConnectOption is used by SetSockOptInt/GetSockOptInt to
+	// specify that connect should be deferred until the first write, so that
+	// the written data can be sent in the SYN. It has the same semantics as
+	// Linux's TCP_FASTOPEN_CONNECT.
+	TCPFastOpenConnectOption
+
 	// IPv6Checksum is used to request the stack to populate and validate the IPv6
 	// checksum for transport level headers.
 	IPv6Checksum
+
+	// UDPSegmentOption is used by SetSockOptInt/GetSockOptInt to specify the
+	// size of the datagrams that writes to a UDP endpoint are segmented into,
+	// as with Linux's UDP_SEGMENT. Zero disables segmentation.
+	UDPSegmentOption
+
+	// PeekOffsetOption is used by SetSockOptInt/GetSockOptInt to specify the
+	// offset at which reads with MSG_PEEK start, as with Linux's SO_PEEK_OFF.
+	// A negative value disables peeking at an offset.
+	PeekOffsetOption
 )
 
 const (
@@ -929,6 +1035,23 @@ const (
 	TCPRACKNoDupTh
 )
 
+// TCPFastOpenOption is a bitmask of the TCP Fast Open roles (TCPFastOpenClient
+// and TCPFastOpenServer) that are enabled in TCP. See RFC 7413.
+type TCPFastOpenOption int
+
+func (*TCPFastOpenOption) isGettableTransportProtocolOption() {}
+
+func (*TCPFastOpenOption) isSettableTransportProtocolOption() {}
+
+const (
+	// TCPFastOpenClient enables sending data in the SYN of active opens.
+	TCPFastOpenClient TCPFastOpenOption = 1 << iota
+
+	// TCPFastOpenServer enables accepting data in the SYN of passive opens
+	// on listening endpoints that enabled it with TCPFastOpenQueueLenOption.
+	TCPFastOpenServer
+)
+
 // TCPDelayEnabled enables/disables Nagle's algorithm in TCP.
 type TCPDelayEnabled bool
 
@@ -1036,8 +1159,6 @@ const (
 )
 
 // TCPInfoOption is used by GetSockOpt to expose TCP statistics.
-//
-// TODO(b/64800844): Add and populate stat fields.
 type TCPInfoOption struct {
 	// RTT is the smoothed round trip time.
 	RTT time.Duration
@@ -1063,10 +1184,199 @@ type TCPInfoOption struct {
 
 	// ReorderSeen indicates if reordering is seen in the endpoint.
 	ReorderSeen bool
+
+	// Retransmits is the number of consecutive retransmission timeouts
+	// without the peer acknowledging new data.
+	Retransmits uint32
+
+	// TotalRetransmits is the number of segments retransmitted since the
+	// start of the connection.
+	TotalRetransmits uint32
+
+	// Timestamps indicates if the TCP timestamp option is in use.
+	Timestamps bool
+
+	// SACKPermitted indicates if SACK was negotiated.
+	SACKPermitted bool
+
+	// SndWndScale and RcvWndScale are the window scale factors in use for
+	// the send and receive windows respectively.
+	SndWndScale uint8
+	RcvWndScale uint8
+
+	// SndMSS is the maximum payload size of a sent segment.
+	SndMSS uint32
+
+	// AdvMSS is the MSS advertised to the peer.
+	AdvMSS uint32
+
+	// Unacked is the number of segments that have been sent but not yet
+	// acknowledged.
+	Unacked uint32
+
+	// Sacked is the number of segments that have been selectively
+	// acknowledged.
+	Sacked uint32
+
+	// MinRTT is the minimum round trip time sampled on the connection.
+	MinRTT time.Duration
+
+	// BytesSent is the number of payload bytes sent, including
+	// retransmissions.
+	BytesSent uint64
+
+	// BytesRetransmitted is the number of payload bytes retransmitted.
+	BytesRetransmitted uint64
+
+	// BytesAcked is the number of bytes acknowledged by the peer.
+	BytesAcked uint64
+
+	// BytesReceived is the number of payload bytes received in sequence.
+	BytesReceived uint64
+
+	// NotSentBytes is the number of bytes in the send queue that have not
+	// been sent yet.
+	NotSentBytes uint32
+
+	// SegmentsSent and SegmentsReceived are the number of segments sent
+	// and received by the endpoint.
+	SegmentsSent     uint64
+	SegmentsReceived uint64
+
+	// DeliveryRate is the most recently sampled rate at which sent data
+	// was acknowledged, in bytes per second.
+	DeliveryRate uint64
+
+	// PacingRate is the pacing rate Linux would use for the connection,
+	// in bytes per second.
+	PacingRate uint64
 }
 
 func (*TCPInfoOption) isGettableSocketOption() {}
 
+// TCPTimer identifies a timer that a TCP endpoint is waiting on. The values
+// match those reported by Linux in /proc/net/tcp.
+type TCPTimer uint8
+
+const (
+	// TCPTimerNone indicates that no timer is pending.
+	TCPTimerNone TCPTimer = iota
+
+	// TCPTimerRetransmit is the retransmission or tail loss probe timer.
+	TCPTimerRetransmit
+
+	// TCPTimerKeepalive is the keepalive timer.
+	TCPTimerKeepalive
+
+	// TCPTimerTimeWait is the timer that ends TIME-WAIT.
+	TCPTimerTimeWait
+
+	// TCPTimerZeroWindowProbe is the zero window probe timer.
+	TCPTimerZeroWindowProbe
+)
+
+// TCPStatusOption is used by GetSockOpt to get the queue lengths and pending
+// timer of a TCP endpoint, as reported by /proc/net/tcp.
+type TCPStatusOption struct {
+	// SendQueue is the number of bytes that have been written but not
+	// acknowledged by the peer. For listening endpoints, it is the maximum
+	// number of connections waiting to be accepted.
+	SendQueue uint32
+
+	// ReceiveQueue is the number of bytes that have been received but not
+	// read. For listening endpoints, it is the number of connections waiting
+	// to be accepted.
+	ReceiveQueue uint32
+
+	// Timer is the timer that the endpoint is waiting on.
+	Timer TCPTimer
+
+	// TimerExpires is the time until Timer expires.
+	TimerExpires time.Duration
+
+	// ZeroWindowProbes is the number of unanswered zero window probes.
+	ZeroWindowProbes uint32
+}
+
+func (*TCPStatusOption) isGettableSocketOption() {}
+
+// SCTPStatusOption is used by GetSockOpt to expose the state of an SCTP
+// association, as reported by SCTP_STATUS.
+type SCTPStatusOption struct {
+	// State is the association state, as an sctp.EndpointState.
+	State EndpointState
+
+	// Rwnd is the peer's current receiver window, in bytes.
+	Rwnd uint32
+
+	// UnackedData is the number of DATA chunks awaiting acknowledgment.
+	UnackedData uint16
+
+	// PendingData is the number of DATA chunks waiting to be sent.
+	PendingData uint16
+
+	// InStreams and OutStreams are the number of inbound and outbound
+	// streams negotiated for the association.
+	InStreams  uint16
+	OutStreams uint16
+
+	// FragmentationPoint is the largest amount of user data carried by a
+	// single DATA chunk.
+	FragmentationPoint uint32
+
+	// PrimaryAddress is the address of the peer.
+	PrimaryAddress FullAddress
+
+	// Cwnd is the congestion window, in bytes.
+	Cwnd uint32
+
+	// SRTT is the smoothed round trip time.
+	SRTT time.Duration
+
+	// RTO is the retransmission timeout.
+	RTO time.Duration
+
+	// MTU is the path MTU available to SCTP packets.
+	MTU uint32
+}
+
+func (*SCTPStatusOption) isGettableSocketOption() {}
+
+// SCTPInitMsgOption is used by SetSockOpt/GetSockOpt to control the
+// parameters used by SCTP when initiating associations, as SCTP_INITMSG.
+//
+// +stateify savable
+type SCTPInitMsgOption struct {
+	// NumOutStreams is the number of outbound streams requested.
+	NumOutStreams uint16
+
+	// MaxInStreams is the maximum number of inbound streams accepted.
+	MaxInStreams uint16
+
+	// MaxAttempts is the maximum number of INIT retransmissions.
+	MaxAttempts uint16
+
+	// MaxInitTimeout bounds the INIT retransmission timeout.
+	MaxInitTimeout time.Duration
+}
+
+func (*SCTPInitMsgOption) isGettableSocketOption() {}
+
+func (*SCTPInitMsgOption) isSettableSocketOption() {}
+
+// SCTPEventsOption is used by SetSockOpt/GetSockOpt to record the SCTP event
+// subscriptions set by SCTP_EVENTS. Bit i is set if the i'th field of struct
+// sctp_event_subscribe is non-zero.
+type SCTPEventsOption uint16
+
+// SCTPEventDataIO is the SCTPEventsOption bit for sctp_data_io_event, which
+// requests SCTP_SNDRCV control messages on received data.
+const SCTPEventDataIO SCTPEventsOption = 1 << 0
+
+func (*SCTPEventsOption) isGettableSocketOption() {}
+
+func (*SCTPEventsOption) isSettableSocketOption() {}
+
 // KeepaliveIdleOption is used by SetSockOpt/GetSockOpt to specify the time a
 // connection must remain idle before the first TCP keepalive packet is sent.
 // Once this time is reached, KeepaliveIntervalOption is used instead.
@@ -1141,6 +1451,24 @@ func (*TCPDeferAcceptOption) isGettableSocketOption() {}
 
 func (*TCPDeferAcceptOption) isSettableSocketOption() {}
 
+// TCPMD5SigOption is used by SetSockOpt to add, replace or remove a TCP MD5
+// signature key (RFC 2385). Segments exchanged with a peer are signed and
+// verified with the key whose address prefix is the longest match for the
+// peer's address.
+type TCPMD5SigOption struct {
+	// Addr is the address of the peer.
+	Addr Address
+
+	// PrefixLen is the number of leading bits of Addr that peers' addresses
+	// must match.
+	PrefixLen int
+
+	// Key is the key. An empty key removes the key for Addr and PrefixLen.
+	Key []byte
+}
+
+func (*TCPMD5SigOption) isSettableSocketOption() {}
+
 // TCPMinRTOOption is use by SetSockOpt/GetSockOpt to allow overriding
 // default MinRTO used by the Stack.
 type TCPMinRTOOption time.Duration
@@ -1352,6 +1680,11 @@ type Route struct {
 
 	// NIC is the id of the nic to be used if this row is viable.
 	NIC NICID
+
+	// Metric is the priority of the row; lower values are preferred. Rows are
+	// considered in route table order, so Metric only affects route selection
+	// through the position of the row in the route table.
+	Metric uint32
 }
 
 // String implements the fmt.Stringer interface.
@@ -1362,6 +1695,9 @@ func (r Route) String() string {
 		_, _ = fmt.Fprintf(&out, " via %s", r.Gateway)
 	}
 	_, _ = fmt.Fprintf(&out, " nic %d", r.NIC)
+	if r.Metric != 0 {
+		_, _ = fmt.Fprintf(&out, " metric %d", r.Metric)
+	}
 	return out.String()
 }
 
@@ -1931,6 +2267,31 @@ type TCPStats struct {
 	// was received.
 	ListenOverflowInvalidSynCookieRcvd *StatCounter
 
+	// FastOpenActive is the number of active opens that sent data in the
+	// SYN with a TCP Fast Open cookie.
+	FastOpenActive *StatCounter
+
+	// FastOpenActiveFail is the number of active opens whose SYN data was not
+	// acknowledged by the peer, and so was retransmitted after the handshake.
+	FastOpenActiveFail *StatCounter
+
+	// FastOpenPassive is the number of passive opens whose SYN data was
+	// accepted by a valid TCP Fast Open cookie.
+	FastOpenPassive *StatCounter
+
+	// FastOpenPassiveFail is the number of SYNs received with an invalid TCP
+	// Fast Open cookie.
+	FastOpenPassiveFail *StatCounter
+
+	// FastOpenListenOverflow is the number of SYNs with a valid TCP Fast Open
+	// cookie whose data was not accepted because too many TCP Fast Open
+	// handshakes were already in progress.
+	FastOpenListenOverflow *StatCounter
+
+	// FastOpenCookieReqd is the number of TCP Fast Open cookie requests
+	// received.
+	FastOpenCookieReqd *StatCounter
+
 	// FailedConnectionAttempts is the number of calls to Connect or Listen
 	// (active and passive openings, respectively) that end in an error.
 	FailedConnectionAttempts *StatCounter
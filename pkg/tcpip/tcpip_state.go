@@ -25,3 +25,11 @@ func (c *ReceivableControlMessages) saveTimestamp() int64 {
 func (c *ReceivableControlMessages) loadTimestamp(nsec int64) {
 	c.Timestamp = time.Unix(0, nsec)
 }
+
+func (e *TimestampingSockError) saveTimestamp() int64 {
+	return e.Timestamp.UnixNano()
+}
+
+func (e *TimestampingSockError) loadTimestamp(nsec int64) {
+	e.Timestamp = time.Unix(0, nsec)
+}
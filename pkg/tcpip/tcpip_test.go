@@ -323,3 +323,51 @@ func TestAddressMatchingPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestZeroCopyNotifications(t *testing.T) {
+	var so SocketOptions
+	send := func(end uint64, sent bool) uint32 {
+		id := so.StartZeroCopySend(0)
+		if sent {
+			so.ExtendZeroCopySend(id, end)
+		}
+		if so.FinishZeroCopySend(id, sent) {
+			t.Fatalf("FinishZeroCopySend(%d, %t) queued a notification before the data was released", id, sent)
+		}
+		return id
+	}
+
+	if id := send(10, true); id != 0 {
+		t.Errorf("got first ID = %d, want 0", id)
+	}
+	if id := send(20, true); id != 1 {
+		t.Errorf("got second ID = %d, want 1", id)
+	}
+	// The ID of a send that didn't write anything is reused.
+	if id := send(0, false); id != 2 {
+		t.Errorf("got ID of empty send = %d, want 2", id)
+	}
+	if id := send(30, true); id != 2 {
+		t.Errorf("got third ID = %d, want 2", id)
+	}
+
+	if !so.ReleaseZeroCopySends(15) {
+		t.Fatalf("ReleaseZeroCopySends(15) didn't queue a notification")
+	}
+	if !so.ReleaseZeroCopySends(30) {
+		t.Fatalf("ReleaseZeroCopySends(30) didn't queue a notification")
+	}
+
+	// Notifications for contiguous IDs are coalesced.
+	err := so.DequeueErr()
+	if err == nil {
+		t.Fatalf("got DequeueErr() = nil, want notification")
+	}
+	want := &ZeroCopySockError{Lo: 0, Hi: 2, Copied: true}
+	if diff := cmp.Diff(want, err.Cause); diff != "" {
+		t.Errorf("notification mismatch (-want +got):\n%s", diff)
+	}
+	if err := so.DequeueErr(); err != nil {
+		t.Errorf("got DequeueErr() = %+v, want nil", err)
+	}
+}
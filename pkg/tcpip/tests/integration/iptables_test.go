@@ -3511,3 +3511,90 @@ func genUDP6(offset int8) stack.PacketBufferPtr {
 	buf := bufferv2.MakeWithData(append([]byte{}, hdr.View()...))
 	return stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: buf})
 }
+
+func TestTPROXY(t *testing.T) {
+	const (
+		srcPort   = 5555
+		dstPort   = 80
+		proxyPort = 8080
+		dataSize  = 4
+	)
+	// An address from the documentation range, which isn't assigned to the
+	// stack.
+	origDstAddr := tcpip.Address("\xc0\x00\x02\x01")
+
+	tests := []struct {
+		name        string
+		transparent bool
+	}{
+		{
+			name:        "transparent socket",
+			transparent: true,
+		},
+		{
+			name:        "non-transparent socket",
+			transparent: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, e := genStackV4(t)
+			defer s.Close()
+
+			ipt := s.IPTables()
+			table := ipt.GetTable(stack.MangleID, false /* ipv6 */)
+			ruleIdx := table.BuiltinChains[stack.Prerouting]
+			table.Rules[ruleIdx].Filter = stack.IPHeaderFilter{
+				Protocol:      header.UDPProtocolNumber,
+				CheckProtocol: true,
+			}
+			table.Rules[ruleIdx].Target = &stack.TPROXYTarget{
+				Port:            proxyPort,
+				Mark:            1,
+				MarkMask:        1,
+				NetworkProtocol: header.IPv4ProtocolNumber,
+			}
+			ipt.ReplaceTable(stack.MangleID, table, false /* ipv6 */)
+
+			var wq waiter.Queue
+			ep, err := s.NewEndpoint(udp.ProtocolNumber, header.IPv4ProtocolNumber, &wq)
+			if err != nil {
+				t.Fatalf("s.NewEndpoint(%d, %d, _): %s", udp.ProtocolNumber, header.IPv4ProtocolNumber, err)
+			}
+			defer ep.Close()
+			ep.SocketOptions().SetTransparent(test.transparent)
+			ep.SocketOptions().SetReceiveOriginalDstAddress(true)
+
+			bindAddr := tcpip.FullAddress{Port: proxyPort}
+			if err := ep.Bind(bindAddr); err != nil {
+				t.Fatalf("ep.Bind(%#v): %s", bindAddr, err)
+			}
+
+			e.InjectInbound(header.IPv4ProtocolNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+				Payload: bufferv2.MakeWithData(udpv4Packet(srcAddrV4, origDstAddr, srcPort, dstPort, dataSize)),
+			}))
+
+			var buf bytes.Buffer
+			res, err := ep.Read(&buf, tcpip.ReadOptions{})
+			if !test.transparent {
+				if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+					t.Fatalf("got ep.Read(_, {}) = (%#v, %s), want = (_, %s)", res, err, &tcpip.ErrWouldBlock{})
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ep.Read(_, {}): %s", err)
+			}
+			if res.Count != dataSize {
+				t.Errorf("got res.Count = %d, want = %d", res.Count, dataSize)
+			}
+			want := tcpip.FullAddress{NIC: nicID, Addr: origDstAddr, Port: dstPort}
+			if !res.ControlMessages.HasOriginalDstAddress {
+				t.Errorf("got res.ControlMessages.HasOriginalDstAddress = false, want = true")
+			} else if got := res.ControlMessages.OriginalDstAddress; got != want {
+				t.Errorf("got res.ControlMessages.OriginalDstAddress = %#v, want = %#v", got, want)
+			}
+		})
+	}
+}
@@ -781,3 +781,189 @@ func TestExternalLoopbackTraffic(t *testing.T) {
 		})
 	}
 }
+
+// TestLocalTCPGSO tests that TCP segments sent between endpoints of the same
+// stack are not segmented to the MTU or the MSS, and that the data arrives
+// intact.
+func TestLocalTCPGSO(t *testing.T) {
+	const (
+		nicID    = 1
+		port     = 80
+		mtu      = 1500
+		smallMSS = 536
+		dataSize = 1 << 20
+		timeout  = 10 * time.Second
+	)
+
+	tests := []struct {
+		name    string
+		linkEP  func() stack.LinkEndpoint
+		userMSS int
+		// wantCoalesced is true if segments larger than the MSS are expected.
+		wantCoalesced bool
+	}{
+		{
+			name:   "loopback",
+			linkEP: loopback.New,
+		},
+		{
+			name:          "loopback with small MSS",
+			linkEP:        loopback.New,
+			userMSS:       smallMSS,
+			wantCoalesced: true,
+		},
+		{
+			name:          "local address",
+			linkEP:        func() stack.LinkEndpoint { return channel.New(1, mtu, "") },
+			wantCoalesced: true,
+		},
+		{
+			name:          "local address with small MSS",
+			linkEP:        func() stack.LinkEndpoint { return channel.New(1, mtu, "") },
+			userMSS:       smallMSS,
+			wantCoalesced: true,
+		},
+	}
+
+	data := make([]byte, dataSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stack.New(stack.Options{
+				NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+				TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol},
+				HandleLocal:        true,
+			})
+			if err := s.CreateNIC(nicID, test.linkEP()); err != nil {
+				t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+			}
+			protocolAddr := tcpip.ProtocolAddress{
+				Protocol:          header.IPv4ProtocolNumber,
+				AddressWithPrefix: utils.Ipv4Addr,
+			}
+			if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+				t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+			}
+			s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+			var listenerWQ waiter.Queue
+			listenerWE, listenerCh := waiter.NewChannelEntry(waiter.ReadableEvents)
+			listenerWQ.EventRegister(&listenerWE)
+			defer listenerWQ.EventUnregister(&listenerWE)
+			listener, err := s.NewEndpoint(tcp.ProtocolNumber, header.IPv4ProtocolNumber, &listenerWQ)
+			if err != nil {
+				t.Fatalf("NewEndpoint(%d, %d, _): %s", tcp.ProtocolNumber, header.IPv4ProtocolNumber, err)
+			}
+			defer listener.Close()
+			if err := listener.Bind(tcpip.FullAddress{Port: port}); err != nil {
+				t.Fatalf("listener.Bind(_): %s", err)
+			}
+			if err := listener.Listen(1); err != nil {
+				t.Fatalf("listener.Listen(1): %s", err)
+			}
+
+			var clientWQ waiter.Queue
+			clientWE, clientCh := waiter.NewChannelEntry(waiter.ReadableEvents)
+			clientWQ.EventRegister(&clientWE)
+			defer clientWQ.EventUnregister(&clientWE)
+			client, err := s.NewEndpoint(tcp.ProtocolNumber, header.IPv4ProtocolNumber, &clientWQ)
+			if err != nil {
+				t.Fatalf("NewEndpoint(%d, %d, _): %s", tcp.ProtocolNumber, header.IPv4ProtocolNumber, err)
+			}
+			defer client.Close()
+			if test.userMSS != 0 {
+				// The client advertises a small MSS, which the server must use
+				// as the size of the packets it accounts for.
+				if err := client.SetSockOptInt(tcpip.MaxSegOption, test.userMSS); err != nil {
+					t.Fatalf("client.SetSockOptInt(tcpip.MaxSegOption, %d): %s", test.userMSS, err)
+				}
+			}
+			connectAddr := tcpip.FullAddress{Addr: utils.Ipv4Addr.Address, Port: port}
+			if err := client.Connect(connectAddr); err != nil {
+				if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
+					t.Fatalf("client.Connect(%#v): %s", connectAddr, err)
+				}
+			}
+
+			select {
+			case <-listenerCh:
+			case <-time.After(timeout):
+				t.Fatalf("timed out waiting for a connection")
+			}
+			server, _, err := listener.Accept(nil)
+			if err != nil {
+				t.Fatalf("listener.Accept(nil): %s", err)
+			}
+			defer server.Close()
+
+			// If the server can't write because its send buffer is full, the
+			// client is guaranteed to become readable, so only wait for the
+			// client.
+			var received bytes.Buffer
+			written := 0
+			for received.Len() < dataSize {
+				if written < dataSize {
+					var r bytes.Reader
+					r.Reset(data[written:])
+					n, err := server.Write(&r, tcpip.WriteOptions{})
+					switch err.(type) {
+					case nil:
+						written += int(n)
+					case *tcpip.ErrWouldBlock:
+					default:
+						t.Fatalf("server.Write(_, {}): %s", err)
+					}
+				}
+
+				// Peeked data must be a prefix of the data read right after.
+				var peeked bytes.Buffer
+				if _, err := client.Read(&peeked, tcpip.ReadOptions{Peek: true}); err != nil {
+					if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+						t.Fatalf("client.Read(_, {Peek: true}): %s", err)
+					}
+				}
+				var read bytes.Buffer
+				if _, err := client.Read(&read, tcpip.ReadOptions{}); err != nil {
+					if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+						t.Fatalf("client.Read(_, {}): %s", err)
+					}
+					select {
+					case <-clientCh:
+					case <-time.After(timeout):
+						t.Fatalf("timed out waiting for data, got %d of %d bytes", received.Len(), dataSize)
+					}
+					continue
+				}
+				if !bytes.HasPrefix(read.Bytes(), peeked.Bytes()) {
+					t.Fatalf("peeked %d bytes that don't match the %d bytes read", peeked.Len(), read.Len())
+				}
+				received.Write(read.Bytes())
+			}
+			if !bytes.Equal(received.Bytes(), data) {
+				t.Fatalf("received data doesn't match sent data")
+			}
+
+			var info tcpip.TCPInfoOption
+			if err := server.GetSockOpt(&info); err != nil {
+				t.Fatalf("server.GetSockOpt(&%T): %s", info, err)
+			}
+			if test.userMSS != 0 && info.SndMSS > uint32(test.userMSS) {
+				t.Errorf("got info.SndMSS = %d, want <= %d", info.SndMSS, test.userMSS)
+			}
+			// Segments are accounted as the number of MSS-sized packets they
+			// would be split into.
+			if minSegs := uint64(dataSize / info.SndMSS); info.SegmentsSent < minSegs {
+				t.Errorf("got info.SegmentsSent = %d, want >= %d", info.SegmentsSent, minSegs)
+			}
+			if test.wantCoalesced {
+				segs := client.Stats().(*tcp.Stats).SegmentsReceived.Value()
+				if maxSegs := uint64(dataSize / info.SndMSS); segs >= maxSegs {
+					t.Errorf("got %d segments received, want < %d", segs, maxSegs)
+				}
+			}
+		})
+	}
+}
@@ -79,6 +79,10 @@ type endpoint struct {
 	// during restore.
 	frozen bool
 	ident  uint16
+
+	// icmpv6Filter is the filter of ICMPv6 message types delivered to the
+	// endpoint. It is only used by IPv6 endpoints.
+	icmpv6Filter tcpip.ICMPv6Filter
 }
 
 func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
@@ -375,7 +379,20 @@ func (e *endpoint) HasNIC(id int32) bool {
 
 // SetSockOpt implements tcpip.Endpoint.
 func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
-	return e.net.SetSockOpt(opt)
+	switch opt := opt.(type) {
+	case *tcpip.ICMPv6Filter:
+		if e.net.NetProto() != header.IPv6ProtocolNumber {
+			return &tcpip.ErrUnknownProtocolOption{}
+		}
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.icmpv6Filter = *opt
+		return nil
+
+	default:
+		return e.net.SetSockOpt(opt)
+	}
 }
 
 // SetSockOptInt implements tcpip.Endpoint.
@@ -403,7 +420,20 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 
 // GetSockOpt implements tcpip.Endpoint.
 func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) tcpip.Error {
-	return e.net.GetSockOpt(opt)
+	switch opt := opt.(type) {
+	case *tcpip.ICMPv6Filter:
+		if e.net.NetProto() != header.IPv6ProtocolNumber {
+			return &tcpip.ErrUnknownProtocolOption{}
+		}
+
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		*opt = e.icmpv6Filter
+		return nil
+
+	default:
+		return e.net.GetSockOpt(opt)
+	}
 }
 
 func send4(s *stack.Stack, ctx *network.WriteContext, ident uint16, data *bufferv2.View, maxHeaderLength uint16) tcpip.Error {
@@ -713,6 +743,12 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt stack.PacketBu
 			e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
 			return
 		}
+		e.mu.RLock()
+		deny := e.icmpv6Filter.ShouldDeny(uint8(h.Type()))
+		e.mu.RUnlock()
+		if deny {
+			return
+		}
 	}
 
 	e.rcvMu.Lock()
@@ -239,6 +239,15 @@ func (c *WriteContext) MTU() uint32 {
 	return c.route.MTU()
 }
 
+// HostGSOMaxSize returns the maximum size of a packet that may be written
+// with host GSO options, or zero if the route doesn't support host GSO.
+func (c *WriteContext) HostGSOMaxSize() uint32 {
+	if !c.route.HasHostGSOCapability() {
+		return 0
+	}
+	return c.route.GSOMaxSize()
+}
+
 // Release releases held resources.
 func (c *WriteContext) Release() {
 	c.route.Release()
@@ -570,6 +579,16 @@ func (e *Endpoint) Disconnect() {
 //
 // +checklocksread:e.mu
 func (e *Endpoint) connectRouteRLocked(nicID tcpip.NICID, localAddr tcpip.Address, addr tcpip.FullAddress, netProto tcpip.NetworkProtocolNumber) (*stack.Route, tcpip.NICID, tcpip.Error) {
+	// An endpoint bound to a device may only send through that device,
+	// regardless of the route table and the multicast interface.
+	bindToDevice := tcpip.NICID(e.ops.GetBindToDevice())
+	if bindToDevice != 0 {
+		if nicID != 0 && nicID != bindToDevice {
+			return nil, 0, &tcpip.ErrHostUnreachable{}
+		}
+		nicID = bindToDevice
+	}
+
 	if len(localAddr) == 0 {
 		localAddr = e.Info().ID.LocalAddress
 		if e.isBroadcastOrMulticast(nicID, netProto, localAddr) {
@@ -588,7 +607,17 @@ func (e *Endpoint) connectRouteRLocked(nicID tcpip.NICID, localAddr tcpip.Addres
 	}
 
 	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	var (
+		r   *stack.Route
+		err tcpip.Error
+	)
+	if e.ops.GetTransparent() {
+		r, err = e.stack.FindTransparentRoute(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	} else if bindToDevice != 0 {
+		r, err = e.stack.FindRouteThroughNIC(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	} else {
+		r, err = e.stack.FindRoute(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	}
 	if err != nil {
 		return nil, 0, err
 	}
@@ -730,9 +759,15 @@ func (e *Endpoint) BindAndThen(addr tcpip.FullAddress, f func(tcpip.NetworkProto
 
 	nicID := addr.NIC
 	if len(addr.Addr) != 0 && !e.isBroadcastOrMulticast(addr.NIC, netProto, addr.Addr) {
-		nicID = e.stack.CheckLocalAddress(nicID, netProto, addr.Addr)
+		nicID = e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
 		if nicID == 0 {
-			return &tcpip.ErrBadLocalAddress{}
+			// With IP_FREEBIND, the address may be assigned to an interface
+			// after the endpoint is bound. With IP_TRANSPARENT, it need never
+			// be.
+			if !e.ops.GetFreeBind() && !e.ops.GetTransparent() {
+				return &tcpip.ErrBadLocalAddress{}
+			}
+			nicID = addr.NIC
 		}
 	}
 
@@ -986,7 +1021,7 @@ func (e *Endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 		delete(e.multicastMemberships, memToRemove)
 
 	case *tcpip.SocketDetachFilterOption:
-		return nil
+		return e.ops.DetachFilter()
 	}
 	return nil
 }
@@ -35,12 +35,17 @@ func (e *Endpoint) Resume(s *stack.Stack) {
 		}
 	}
 
+	// The stack may have been restored with different addresses than the ones
+	// it was saved with.
 	info := e.Info()
+	info.ID.LocalAddress = e.stack.RewriteRestoredAddress(info.ID.LocalAddress)
+	info.BindAddr = e.stack.RewriteRestoredAddress(info.BindAddr)
+	e.setInfo(info)
 
 	switch state := e.State(); state {
 	case transport.DatagramEndpointStateInitial, transport.DatagramEndpointStateClosed:
 	case transport.DatagramEndpointStateBound:
-		if len(info.ID.LocalAddress) != 0 && !e.isBroadcastOrMulticast(info.RegisterNICID, e.effectiveNetProto, info.ID.LocalAddress) {
+		if len(info.ID.LocalAddress) != 0 && !e.isBroadcastOrMulticast(info.RegisterNICID, e.effectiveNetProto, info.ID.LocalAddress) && !e.ops.GetFreeBind() && !e.ops.GetTransparent() {
 			if e.stack.CheckLocalAddress(info.RegisterNICID, e.effectiveNetProto, info.ID.LocalAddress) == 0 {
 				panic(fmt.Sprintf("got e.stack.CheckLocalAddress(%d, %d, %s) = 0, want != 0", info.RegisterNICID, e.effectiveNetProto, info.ID.LocalAddress))
 			}
@@ -48,9 +53,13 @@ func (e *Endpoint) Resume(s *stack.Stack) {
 	case transport.DatagramEndpointStateConnected:
 		var err tcpip.Error
 		multicastLoop := e.ops.GetMulticastLoop()
-		e.connectedRoute, err = e.stack.FindRoute(info.RegisterNICID, info.ID.LocalAddress, info.ID.RemoteAddress, e.effectiveNetProto, multicastLoop)
+		findRoute := e.stack.FindRoute
+		if e.ops.GetTransparent() {
+			findRoute = e.stack.FindTransparentRoute
+		}
+		e.connectedRoute, err = findRoute(info.RegisterNICID, info.ID.LocalAddress, info.ID.RemoteAddress, e.effectiveNetProto, multicastLoop)
 		if err != nil {
-			panic(fmt.Sprintf("e.stack.FindRoute(%d, %s, %s, %d, %t): %s", info.RegisterNICID, info.ID.LocalAddress, info.ID.RemoteAddress, e.effectiveNetProto, multicastLoop, err))
+			panic(fmt.Sprintf("findRoute(%d, %s, %s, %d, %t): %s", info.RegisterNICID, info.ID.LocalAddress, info.ID.RemoteAddress, e.effectiveNetProto, multicastLoop, err))
 		}
 	default:
 		panic(fmt.Sprintf("unhandled state = %s", state))
@@ -49,6 +49,49 @@ type packet struct {
 	packetInfo tcpip.LinkPacketInfo
 }
 
+// ReceivedPacket describes a packet delivered to a ReceiveHandler.
+type ReceivedPacket struct {
+	// Data holds the packet as it would be read from the endpoint, including
+	// any link headers for non-cooked endpoints.
+	Data []byte
+
+	// LinkHeaderLen is the number of bytes at the start of Data preceding the
+	// network header.
+	LinkHeaderLen int
+
+	// ReceivedAt is the time at which the packet was received.
+	ReceivedAt time.Time
+
+	// SenderAddr is the link address of the sender.
+	SenderAddr tcpip.FullAddress
+
+	// PacketInfo holds additional information about the packet.
+	PacketInfo tcpip.LinkPacketInfo
+}
+
+// ReceiveHandler consumes packets delivered to a packet endpoint in place of
+// the endpoint's receive queue, e.g. to place them in a memory-mapped ring.
+type ReceiveHandler interface {
+	// HandlePacket consumes pkt. It returns true if waiters on the endpoint
+	// should be notified that the endpoint is readable.
+	//
+	// HandlePacket is called with the endpoint's receive lock held, so it must
+	// not call back into the endpoint.
+	HandlePacket(pkt *ReceivedPacket) bool
+
+	// Readable returns true if the handler holds packets that have not yet
+	// been consumed by the application.
+	Readable() bool
+}
+
+// ReceiveHandlerSetter is implemented by packet endpoints that support
+// diverting received packets to a ReceiveHandler.
+type ReceiveHandlerSetter interface {
+	// SetReceiveHandler sets the handler that received packets are delivered
+	// to. If h is nil, packets are queued for reading again.
+	SetReceiveHandler(h ReceiveHandler)
+}
+
 // endpoint is the packet socket implementation of tcpip.Endpoint. It is legal
 // to have goroutines make concurrent calls into the endpoint.
 //
@@ -79,6 +122,8 @@ type endpoint struct {
 	rcvClosed bool
 	// +checklocks:rcvMu
 	rcvDisabled bool
+	// +checklocks:rcvMu
+	rcvHandler ReceiveHandler
 
 	mu sync.RWMutex `state:"nosave"`
 	// +checklocks:mu
@@ -153,6 +198,13 @@ func (ep *endpoint) Close() {
 	ep.waiterQueue.Notify(waiter.EventHUp | waiter.EventErr | waiter.ReadableEvents | waiter.WritableEvents)
 }
 
+// SetReceiveHandler implements ReceiveHandlerSetter.SetReceiveHandler.
+func (ep *endpoint) SetReceiveHandler(h ReceiveHandler) {
+	ep.rcvMu.Lock()
+	defer ep.rcvMu.Unlock()
+	ep.rcvHandler = h
+}
+
 // ModerateRecvBuf implements tcpip.Endpoint.ModerateRecvBuf.
 func (*endpoint) ModerateRecvBuf(int) {}
 
@@ -350,7 +402,7 @@ func (ep *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 	// Determine whether the endpoint is readable.
 	if (mask & waiter.ReadableEvents) != 0 {
 		ep.rcvMu.Lock()
-		if !ep.rcvList.Empty() || ep.rcvClosed {
+		if !ep.rcvList.Empty() || ep.rcvClosed || (ep.rcvHandler != nil && ep.rcvHandler.Readable()) {
 			result |= waiter.ReadableEvents
 		}
 		ep.rcvMu.Unlock()
@@ -365,7 +417,7 @@ func (ep *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 func (ep *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 	switch opt.(type) {
 	case *tcpip.SocketDetachFilterOption:
-		return nil
+		return ep.ops.DetachFilter()
 
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
@@ -418,6 +470,11 @@ func (ep *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 
 // HandlePacket implements stack.PacketEndpoint.HandlePacket.
 func (ep *endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) {
+	snapLen, ok := ep.runFilter(nicID, netProto, pkt)
+	if !ok {
+		return
+	}
+
 	ep.rcvMu.Lock()
 
 	// Drop the packet if our buffer is currently full.
@@ -428,6 +485,11 @@ func (ep *endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtoc
 		return
 	}
 
+	if ep.rcvHandler != nil && !ep.rcvDisabled {
+		ep.handlePacketLocked(nicID, netProto, pkt, snapLen)
+		return
+	}
+
 	rcvBufSize := ep.ops.GetReceiveBufferSize()
 	if ep.rcvDisabled || ep.rcvBufSize >= int(rcvBufSize) {
 		ep.rcvMu.Unlock()
@@ -460,6 +522,11 @@ func (ep *endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtoc
 		// Cooked packet endpoints don't include the link-headers in received
 		// packets.
 		pktBuf.TrimFront(int64(len(pkt.LinkHeader().Slice()) + len(pkt.VirtioNetHeader().Slice())))
+	} else if snapLen >= 0 {
+		snapLen += len(pkt.VirtioNetHeader().Slice())
+	}
+	if snapLen >= 0 {
+		pktBuf.Truncate(int64(snapLen))
 	}
 	rcvdPkt.data = stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: pktBuf})
 
@@ -474,6 +541,82 @@ func (ep *endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtoc
 	}
 }
 
+// runFilter runs the socket filter attached to the endpoint, if any, over pkt.
+// It returns false if the packet must be dropped. Otherwise, it returns the
+// number of bytes of the packet, from its link header for raw endpoints and
+// from its network header for cooked endpoints, to deliver; a negative length
+// means that all of the packet is delivered.
+func (ep *endpoint) runFilter(nicID tcpip.NICID, netProto tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) (int, bool) {
+	if !ep.ops.HasFilter() {
+		return -1, true
+	}
+
+	pktBuf := pkt.ToBuffer()
+	defer pktBuf.Release()
+	hdrLen := len(pkt.VirtioNetHeader().Slice())
+	if ep.cooked {
+		hdrLen += len(pkt.LinkHeader().Slice())
+	}
+	pktBuf.TrimFront(int64(hdrLen))
+	data := pktBuf.Flatten()
+	n := ep.ops.RunFilter(data, tcpip.SocketFilterInfo{
+		Protocol: netProto,
+		PktType:  pkt.PktType,
+		NIC:      nicID,
+	})
+	if n == 0 {
+		return 0, false
+	}
+	if n == len(data) {
+		return -1, true
+	}
+	return n, true
+}
+
+// handlePacketLocked delivers pkt to the endpoint's receive handler, truncated
+// to snapLen bytes if snapLen is non-negative.
+//
+// +checklocksrelease:ep.rcvMu
+func (ep *endpoint) handlePacketLocked(nicID tcpip.NICID, netProto tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr, snapLen int) {
+	rp := ReceivedPacket{
+		PacketInfo: tcpip.LinkPacketInfo{
+			Protocol: netProto,
+			PktType:  pkt.PktType,
+		},
+		SenderAddr: tcpip.FullAddress{
+			NIC: nicID,
+		},
+		ReceivedAt: ep.stack.Clock().Now(),
+	}
+	if len(pkt.LinkHeader().Slice()) != 0 {
+		hdr := header.Ethernet(pkt.LinkHeader().Slice())
+		rp.SenderAddr.Addr = tcpip.Address(hdr.SourceAddress())
+	}
+
+	pktBuf := pkt.ToBuffer()
+	linkHeaderLen := len(pkt.LinkHeader().Slice()) + len(pkt.VirtioNetHeader().Slice())
+	if ep.cooked {
+		pktBuf.TrimFront(int64(linkHeaderLen))
+	} else {
+		rp.LinkHeaderLen = linkHeaderLen
+		if snapLen >= 0 {
+			snapLen += len(pkt.VirtioNetHeader().Slice())
+		}
+	}
+	if snapLen >= 0 {
+		pktBuf.Truncate(int64(snapLen))
+	}
+	rp.Data = pktBuf.Flatten()
+	pktBuf.Release()
+
+	notify := ep.rcvHandler.HandlePacket(&rp)
+	ep.rcvMu.Unlock()
+	ep.stats.PacketsReceived.Increment()
+	if notify {
+		ep.waiterQueue.Notify(waiter.ReadableEvents)
+	}
+}
+
 // State implements socket.Socket.State.
 func (*endpoint) State() uint32 {
 	return 0
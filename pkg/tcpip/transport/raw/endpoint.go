@@ -487,7 +487,7 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 	switch opt := opt.(type) {
 	case *tcpip.SocketDetachFilterOption:
-		return nil
+		return e.ops.DetachFilter()
 
 	case *tcpip.ICMPv6Filter:
 		if e.net.NetProto() != header.IPv6ProtocolNumber {
@@ -570,6 +570,12 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 		e.rcvMu.Unlock()
 		return v, nil
 
+	case tcpip.ReceiveBufferUsedOption:
+		e.rcvMu.Lock()
+		v := e.rcvBufSize
+		e.rcvMu.Unlock()
+		return v, nil
+
 	case tcpip.IPv6Checksum:
 		if e.net.NetProto() != header.IPv6ProtocolNumber {
 			return 0, &tcpip.ErrUnknownProtocolOption{}
@@ -723,6 +729,20 @@ func (e *endpoint) HandlePacket(pkt stack.PacketBufferPtr) {
 			panic(fmt.Sprintf("unrecognized protocol number = %d", info.NetProto))
 		}
 
+		// The socket filter sees the data that would be delivered to the
+		// application, and may drop or truncate it.
+		if e.ops.HasFilter() {
+			n := e.ops.RunFilter(combinedBuf.Flatten(), tcpip.SocketFilterInfo{
+				Protocol: pkt.NetworkProtocolNumber,
+				PktType:  pkt.PktType,
+				NIC:      pkt.NICID,
+			})
+			if n == 0 {
+				return false
+			}
+			combinedBuf.Truncate(int64(n))
+		}
+
 		packet.data = stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: combinedBuf.Clone()})
 		packet.receivedAt = e.stack.Clock().Now()
 
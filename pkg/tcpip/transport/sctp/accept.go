@@ -0,0 +1,317 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"encoding/binary"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/ports"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// HandlePacket implements stack.TransportEndpoint.HandlePacket.
+func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt stack.PacketBufferPtr) {
+	p, ok := parsePacket(pkt)
+	if !ok {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return
+	}
+	e.stats.PacketsReceived.Increment()
+
+	e.mu.Lock()
+	var (
+		n    *endpoint
+		rest []byte
+	)
+	switch {
+	case e.state == StateListen:
+		n, rest = e.handleListenPacketLocked(id, pkt, p)
+	case e.state.connecting(), e.state.connected():
+		e.handlePacketLocked(p)
+	}
+	e.unlockAndFlush()
+
+	// The new endpoint's COOKIE ACK is sent after releasing the listener's
+	// lock, along with the response to any chunks bundled after the COOKIE
+	// ECHO chunk.
+	if n != nil {
+		n.mu.Lock()
+		if len(rest) != 0 {
+			n.handlePacketLocked(packet{hdr: p.hdr, chunks: rest})
+		}
+		n.unlockAndFlush()
+	}
+}
+
+// handleListenPacketLocked processes a packet received by a listening
+// endpoint. If the packet completes a handshake, it returns the new endpoint
+// and the chunks that follow the COOKIE ECHO chunk.
+//
+// Precondition: e.mu must be held and e.state must be StateListen.
+func (e *endpoint) handleListenPacketLocked(id stack.TransportEndpointID, pkt stack.PacketBufferPtr, p packet) (*endpoint, []byte) {
+	c, rest, ok := header.SCTPNextChunk(p.chunks)
+	if !ok {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return nil, nil
+	}
+	switch c.Type() {
+	case header.SCTPChunkInit:
+		// An INIT chunk must be alone in a packet with a zero tag.
+		if p.hdr.VerificationTag() != 0 || len(rest) != 0 {
+			return nil, nil
+		}
+		e.handleInitLocked(id, pkt, c)
+		return nil, nil
+	case header.SCTPChunkCookieEcho:
+		n := e.handleCookieEchoLocked(id, pkt, p, c)
+		if n == nil {
+			return nil, nil
+		}
+		return n, rest
+	default:
+		vtag, reply, malformed := outOfTheBlueReply(p)
+		if malformed {
+			e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		}
+		if reply != nil {
+			e.queueReplyLocked(id, pkt, vtag, reply)
+		}
+		return nil, nil
+	}
+}
+
+// queueReplyLocked queues a packet carrying chunks in response to pkt,
+// which was received with the given id.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) queueReplyLocked(id stack.TransportEndpointID, pkt stack.PacketBufferPtr, vtag uint32, chunks []byte) {
+	r, err := e.stack.FindRoute(pkt.NICID, id.LocalAddress, id.RemoteAddress, pkt.NetworkProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		return
+	}
+	e.outbox = append(e.outbox, outPacket{
+		route:   r,
+		srcPort: id.LocalPort,
+		dstPort: id.RemotePort,
+		vtag:    vtag,
+		chunks:  chunks,
+		ttl:     e.ttl,
+		tos:     e.tos,
+	})
+}
+
+// handleInitLocked answers an INIT chunk with an INIT ACK chunk that carries
+// a State Cookie. No state is kept until the cookie is echoed back.
+//
+// Precondition: e.mu must be held and e.state must be StateListen.
+func (e *endpoint) handleInitLocked(id stack.TransportEndpointID, pkt stack.PacketBufferPtr, c header.SCTPChunk) {
+	init := header.SCTPInit(c.Value())
+	if len(init) < header.SCTPInitHeaderSize-header.SCTPChunkHeaderSize || init.InitiateTag() == 0 || init.OutboundStreams() == 0 || init.InboundStreams() == 0 {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return
+	}
+
+	var unrecognized []byte
+	for params := init.Params(); len(params) != 0; {
+		typ, value, rest, ok := header.SCTPNextParam(params)
+		if !ok {
+			e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+			return
+		}
+		params = rest
+		switch typ {
+		case header.SCTPParamIPv4Address, header.SCTPParamIPv6Address, header.SCTPParamCookiePreservative, header.SCTPParamSupportedAddressTypes:
+			// Only the source address of the packet is used.
+		default:
+			// The two high bits of an unrecognized parameter type select
+			// whether the chunk is discarded and whether the parameter is
+			// reported (RFC 9260 section 3.2.1).
+			if typ&0x8000 == 0 {
+				return
+			}
+			if typ&0x4000 != 0 {
+				unrecognized = header.SCTPAppendParam(unrecognized, header.SCTPParamUnrecognized, header.SCTPAppendParam(nil, typ, value))
+			}
+		}
+	}
+
+	cookie := stateCookie{
+		created:    e.stack.Clock().Now().UnixNano(),
+		localVTag:  e.randomTag(),
+		peerVTag:   init.InitiateTag(),
+		localTSN:   e.randomUint32(),
+		peerTSN:    init.InitialTSN(),
+		peerRwnd:   init.ARwnd(),
+		outStreams: e.initMsg.NumOutStreams,
+		inStreams:  e.initMsg.MaxInStreams,
+		localPort:  id.LocalPort,
+		peerPort:   id.RemotePort,
+		localAddr:  id.LocalAddress,
+		peerAddr:   id.RemoteAddress,
+	}
+	if n := init.InboundStreams(); n < cookie.outStreams {
+		cookie.outStreams = n
+	}
+	if n := init.OutboundStreams(); n < cookie.inStreams {
+		cookie.inStreams = n
+	}
+
+	f := header.SCTPInitFields{
+		InitiateTag:     cookie.localVTag,
+		ARwnd:           uint32(e.ops.GetReceiveBufferSize()),
+		OutboundStreams: cookie.outStreams,
+		InboundStreams:  cookie.inStreams,
+		InitialTSN:      cookie.localTSN,
+	}
+	value := header.SCTPAppendParam(f.Encode(), header.SCTPParamStateCookie, cookie.encode(e.cookieSecret))
+	value = append(value, unrecognized...)
+	e.queueReplyLocked(id, pkt, cookie.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkInitAck, 0, value))
+}
+
+// handleCookieEchoLocked validates the State Cookie carried by a COOKIE ECHO
+// chunk and creates the endpoint of the new association, which is added to
+// the accept queue.
+//
+// Precondition: e.mu must be held and e.state must be StateListen.
+func (e *endpoint) handleCookieEchoLocked(id stack.TransportEndpointID, pkt stack.PacketBufferPtr, p packet, c header.SCTPChunk) *endpoint {
+	cookie, ok := decodeCookie(c.Value(), e.cookieSecret)
+	if !ok || p.hdr.VerificationTag() != cookie.localVTag {
+		return nil
+	}
+	if cookie.localPort != id.LocalPort || cookie.peerPort != id.RemotePort || cookie.localAddr != id.LocalAddress || cookie.peerAddr != id.RemoteAddress {
+		return nil
+	}
+	if age := time.Duration(e.stack.Clock().Now().UnixNano() - cookie.created); age > validCookieLife {
+		// The measure of staleness is in microseconds (RFC 9260 section
+		// 3.3.10.3).
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32((age-validCookieLife)/time.Microsecond))
+		cause := header.SCTPAppendParam(nil, header.SCTPCauseStaleCookie, b[:])
+		e.queueReplyLocked(id, pkt, cookie.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkError, 0, cause))
+		return nil
+	}
+	if len(e.acceptQueue) > e.backlog {
+		// The peer retransmits the COOKIE ECHO chunk, by which time the
+		// accept queue may have drained.
+		e.stack.Stats().DroppedPackets.Increment()
+		return nil
+	}
+
+	n := e.newChildLocked(id, pkt, &cookie)
+	if n == nil {
+		return nil
+	}
+	e.acceptQueue = append(e.acceptQueue, n)
+	e.notifyLocked(waiter.ReadableEvents)
+	return n
+}
+
+// newChildLocked creates the endpoint of an association established from
+// cookie. The COOKIE ACK chunk is queued in the new endpoint's outbox.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) newChildLocked(id stack.TransportEndpointID, pkt stack.PacketBufferPtr, cookie *stateCookie) *endpoint {
+	netProto := pkt.NetworkProtocolNumber
+	r, err := e.stack.FindRoute(pkt.NICID, id.LocalAddress, id.RemoteAddress, netProto, false /* multicastLoop */)
+	if err != nil {
+		return nil
+	}
+
+	n := newEndpoint(e.stack, e.NetProto, &waiter.Queue{})
+	n.ops.SetSendBufferSize(e.ops.GetSendBufferSize(), false /* notify */)
+	n.ops.SetReceiveBufferSize(e.ops.GetReceiveBufferSize(), false /* notify */)
+	n.ops.SetDelayOption(e.ops.GetDelayOption())
+	n.ops.SetV6Only(e.ops.GetV6Only())
+	n.ops.SetLinger(e.ops.GetLinger())
+	n.ttl = e.ttl
+	n.tos = e.tos
+	n.initMsg = e.initMsg
+	n.events = e.events
+	n.portFlags = e.portFlags
+	n.bindToDevice = e.bindToDevice
+
+	netProtos := []tcpip.NetworkProtocolNumber{netProto}
+	res := ports.Reservation{
+		Networks:     netProtos,
+		Transport:    ProtocolNumber,
+		Addr:         id.LocalAddress,
+		Port:         id.LocalPort,
+		Flags:        e.portFlags,
+		BindToDevice: e.bindToDevice,
+		Dest: tcpip.FullAddress{
+			Addr: id.RemoteAddress,
+			Port: id.RemotePort,
+		},
+	}
+	if !e.stack.ReserveTuple(res) {
+		r.Release()
+		return nil
+	}
+
+	// n becomes visible to the demuxer once registered, so it is
+	// initialized under its lock.
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := e.stack.RegisterTransportEndpoint(netProtos, ProtocolNumber, id, n, n.portFlags, n.bindToDevice); err != nil {
+		e.stack.ReleasePort(res)
+		r.Release()
+		return nil
+	}
+	n.portRes = res
+	n.isPortReserved = true
+	n.isRegistered = true
+	n.effectiveNetProtos = netProtos
+	n.ID = id
+	n.RegisterNICID = r.NICID()
+	n.route = r
+	n.assoc.initFromCookie(n, cookie)
+	n.state = StateEstablished
+	n.connectNotified = true
+	n.queuePacketLocked(n.assoc.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkCookieAck, 0, nil))
+	return n
+}
+
+// outOfTheBlueReply returns the response to a packet that does not belong to
+// any association, as described in RFC 9260 section 8.4. reply is nil if the
+// packet must be discarded silently.
+func outOfTheBlueReply(p packet) (vtag uint32, reply []byte, malformed bool) {
+	vtag = p.hdr.VerificationTag()
+	flags := uint8(header.SCTPFlagTagReflected)
+	replyType := header.SCTPChunkAbort
+	for b := p.chunks; len(b) != 0; {
+		c, rest, ok := header.SCTPNextChunk(b)
+		if !ok {
+			return 0, nil, true
+		}
+		b = rest
+		switch c.Type() {
+		case header.SCTPChunkAbort, header.SCTPChunkShutdownComplete, header.SCTPChunkCookieEcho, header.SCTPChunkCookieAck, header.SCTPChunkError:
+			return 0, nil, false
+		case header.SCTPChunkInit:
+			if len(c.Value()) < header.SCTPInitHeaderSize-header.SCTPChunkHeaderSize {
+				return 0, nil, true
+			}
+			vtag = header.SCTPInit(c.Value()).InitiateTag()
+			flags = 0
+		case header.SCTPChunkShutdownAck:
+			replyType = header.SCTPChunkShutdownComplete
+		}
+	}
+	return vtag, header.SCTPAppendChunk(nil, replyType, flags, nil), false
+}
@@ -0,0 +1,1371 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// maxGapBlocks and maxDupTSNs bound the size of the SACK chunks that
+	// are sent, so that they always fit in a single packet.
+	maxGapBlocks = 128
+	maxDupTSNs   = 16
+
+	// maxTSNWindow is the furthest ahead of the cumulative TSN that a
+	// received DATA chunk may be, since gap ack blocks carry 16-bit
+	// offsets.
+	maxTSNWindow = 0xffff
+
+	// minMTU is the smallest MTU accepted from a Packet Too Big indication.
+	minMTU = 512
+)
+
+// tsnLT returns true if TSN a precedes TSN b in serial number arithmetic.
+func tsnLT(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// outChunk is a DATA chunk that is queued for transmission or waiting to be
+// acknowledged.
+type outChunk struct {
+	fields header.SCTPDataFields
+	flags  uint8
+	data   []byte
+
+	// sent is set once the chunk has been transmitted.
+	sent bool
+
+	// acked is set while the chunk is covered by a gap ack block of the
+	// most recent SACK.
+	acked bool
+
+	// retransmit is set if the chunk is to be retransmitted.
+	retransmit bool
+
+	// retransmitted is set once the chunk has been retransmitted, which
+	// excludes it from RTT measurements.
+	retransmitted bool
+
+	// missed counts the SACKs that reported the chunk missing, for fast
+	// retransmission.
+	missed int
+}
+
+// inChunk is a received DATA chunk that is waiting for the rest of its
+// message.
+type inChunk struct {
+	fields header.SCTPDataFields
+	flags  uint8
+	data   []byte
+}
+
+// message is a received user message.
+type message struct {
+	data []byte
+	off  int
+	info tcpip.SCTPSndRcvInfo
+}
+
+// inStream holds the ordered delivery state of an inbound stream.
+type inStream struct {
+	nextSSN uint16
+
+	// held holds messages that arrived ahead of nextSSN.
+	held map[uint16]*message
+}
+
+// timer is an association timer. The function it is initialized with is
+// called with the endpoint's lock held when the timer expires.
+type timer struct {
+	e     *endpoint
+	fire  func()
+	timer tcpip.Timer
+
+	// armed is set while the timer is running, and deadline is when it
+	// expires.
+	armed    bool
+	deadline tcpip.MonotonicTime
+}
+
+func (t *timer) init(e *endpoint, fire func()) {
+	t.e = e
+	t.fire = fire
+}
+
+// start (re)starts the timer to expire after d.
+func (t *timer) start(d time.Duration) {
+	t.armed = true
+	t.deadline = t.e.stack.Clock().NowMonotonic().Add(d)
+	if t.timer == nil {
+		t.timer = t.e.stack.Clock().AfterFunc(d, t.expire)
+	} else {
+		t.timer.Reset(d)
+	}
+}
+
+// stop stops the timer.
+func (t *timer) stop() {
+	t.armed = false
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+func (t *timer) expire() {
+	e := t.e
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+
+	if !t.armed {
+		return
+	}
+	// The timer may have been restarted after this callback was
+	// scheduled.
+	if now := e.stack.Clock().NowMonotonic(); now.Before(t.deadline) {
+		t.timer.Reset(t.deadline.Sub(now))
+		return
+	}
+	t.armed = false
+	t.fire()
+}
+
+// association holds the state of an SCTP association. It is protected by
+// the lock of the endpoint that carries it.
+type association struct {
+	localVTag uint32
+	peerVTag  uint32
+
+	outStreams uint16
+	inStreams  uint16
+
+	// The following fields hold the state of the data sender.
+
+	// nextTSN is the TSN assigned to the next DATA chunk.
+	nextTSN uint32
+
+	// cumAckPoint is the highest TSN cumulatively acknowledged by the peer.
+	cumAckPoint uint32
+
+	// sndQueue holds the DATA chunks that have not been cumulatively
+	// acknowledged, in TSN order.
+	sndQueue []*outChunk
+
+	// sndBufUsed is the number of bytes of user data in sndQueue.
+	sndBufUsed int
+
+	// outSSN holds the next stream sequence number of each outbound stream
+	// that has been used.
+	outSSN map[uint16]uint16
+
+	peerRwnd          uint32
+	cwnd              uint32
+	ssthresh          uint32
+	partialBytesAcked uint32
+	mtu               uint32
+
+	// fastRecovery is set while recovering from a fast retransmission, until
+	// recoverTSN is acknowledged.
+	fastRecovery bool
+	recoverTSN   uint32
+
+	rto    time.Duration
+	srtt   time.Duration
+	rttvar time.Duration
+
+	// rttPending is set while the round trip time is being measured using
+	// the DATA chunk with TSN rttTSN, sent at rttStart.
+	rttPending bool
+	rttTSN     uint32
+	rttStart   tcpip.MonotonicTime
+
+	// errorCount counts consecutive retransmission timeouts.
+	errorCount int
+
+	// initChunk and cookieEcho are the INIT and COOKIE ECHO chunks, kept
+	// for retransmission.
+	initChunk   []byte
+	cookieEcho  []byte
+	initRetries int
+
+	// The following fields hold the state of the data receiver.
+
+	// rcvCumTSN is the highest TSN up to which all DATA chunks have been
+	// received.
+	rcvCumTSN uint32
+
+	// rcvGaps holds the TSNs received beyond rcvCumTSN.
+	rcvGaps map[uint32]struct{}
+
+	// rcvChunks holds received DATA chunks that are waiting for the rest of
+	// their message.
+	rcvChunks map[uint32]*inChunk
+
+	// rcvDups holds duplicate TSNs to be reported in the next SACK.
+	rcvDups []uint32
+
+	// rcvStreams holds the state of each inbound stream that has been used.
+	rcvStreams map[uint16]*inStream
+
+	// rcvQueue holds the messages ready to be read.
+	rcvQueue []*message
+
+	// rcvBufUsed is the number of bytes of user data received and not yet
+	// read, including incomplete messages.
+	rcvBufUsed int
+
+	// rcvClosed is set once the endpoint has been shut down for reading.
+	rcvClosed bool
+
+	// sackPending counts the packets carrying DATA chunks that have not
+	// been acknowledged, and sackNow is set if a SACK must be sent without
+	// delay.
+	sackPending int
+	sackNow     bool
+
+	// lastAdvertisedRwnd is the receive window advertised in the last SACK.
+	lastAdvertisedRwnd uint32
+
+	// t1 is the T1-init and T1-cookie timer, t2 is the T2-shutdown timer,
+	// t3 is the T3-rtx timer and sackTimer is the delayed SACK timer.
+	t1        timer
+	t2        timer
+	t3        timer
+	sackTimer timer
+}
+
+// init prepares the association of e. Parameters negotiated with the peer
+// are filled in during the handshake.
+func (a *association) init(e *endpoint) {
+	*a = association{
+		localVTag:  e.randomTag(),
+		nextTSN:    e.randomUint32(),
+		outSSN:     make(map[uint16]uint16),
+		mtu:        e.route.MTU(),
+		rto:        rtoInitial,
+		rcvGaps:    make(map[uint32]struct{}),
+		rcvChunks:  make(map[uint32]*inChunk),
+		rcvStreams: make(map[uint16]*inStream),
+	}
+	a.cumAckPoint = a.nextTSN - 1
+	a.cwnd = a.initialCwnd()
+	a.t1.init(e, e.onT1Locked)
+	a.t2.init(e, e.onT2Locked)
+	a.t3.init(e, e.onT3Locked)
+	a.sackTimer.init(e, e.onSackTimerLocked)
+}
+
+// initFromCookie prepares the association of e from a State Cookie.
+func (a *association) initFromCookie(e *endpoint, c *stateCookie) {
+	a.init(e)
+	a.localVTag = c.localVTag
+	a.peerVTag = c.peerVTag
+	a.nextTSN = c.localTSN
+	a.cumAckPoint = c.localTSN - 1
+	a.rcvCumTSN = c.peerTSN - 1
+	a.peerRwnd = c.peerRwnd
+	a.ssthresh = c.peerRwnd
+	a.outStreams = c.outStreams
+	a.inStreams = c.inStreams
+}
+
+// initialCwnd returns the initial congestion window of RFC 9260 section
+// 7.2.1.
+func (a *association) initialCwnd() uint32 {
+	cwnd := 2 * a.mtu
+	if cwnd < 4404 {
+		cwnd = 4404
+	}
+	if cwnd > 4*a.mtu {
+		cwnd = 4 * a.mtu
+	}
+	return cwnd
+}
+
+// stopTimers stops all association timers.
+func (a *association) stopTimers() {
+	a.t1.stop()
+	a.t2.stop()
+	a.t3.stop()
+	a.sackTimer.stop()
+}
+
+// fragPoint returns the largest amount of user data carried by a DATA chunk.
+func (a *association) fragPoint() int {
+	n := int(a.mtu) - header.SCTPMinimumSize - header.SCTPDataHeaderSize
+	if n < 0 {
+		return 0
+	}
+	return n &^ 3
+}
+
+// updateMTU lowers the path MTU following a Packet Too Big indication.
+func (a *association) updateMTU(mtu uint32) {
+	if mtu >= minMTU && mtu < a.mtu {
+		a.mtu = mtu
+	}
+}
+
+// chunkCounts returns the number of DATA chunks that are outstanding and the
+// number that have not been sent yet.
+func (a *association) chunkCounts() (unacked, pending int) {
+	for _, c := range a.sndQueue {
+		if !c.sent {
+			pending++
+		} else if !c.acked {
+			unacked++
+		}
+	}
+	return unacked, pending
+}
+
+// flightSize returns the number of bytes of user data that are outstanding.
+func (a *association) flightSize() int {
+	n := 0
+	for _, c := range a.sndQueue {
+		if c.sent && !c.acked && !c.retransmit {
+			n += len(c.data)
+		}
+	}
+	return n
+}
+
+// queueMessage fragments a user message into DATA chunks and appends them to
+// the send queue.
+func (a *association) queueMessage(data []byte, info tcpip.SCTPSndRcvInfo) {
+	var ssn uint16
+	if !info.Unordered {
+		ssn = a.outSSN[info.Stream]
+		a.outSSN[info.Stream] = ssn + 1
+	}
+	fragPoint := a.fragPoint()
+	for off := 0; ; {
+		n := len(data) - off
+		if n > fragPoint {
+			n = fragPoint
+		}
+		var flags uint8
+		if off == 0 {
+			flags |= header.SCTPDataFlagBeginning
+		}
+		if off+n == len(data) {
+			flags |= header.SCTPDataFlagEnd
+		}
+		if info.Unordered {
+			flags |= header.SCTPDataFlagUnordered
+		}
+		a.sndQueue = append(a.sndQueue, &outChunk{
+			fields: header.SCTPDataFields{
+				TSN:            a.nextTSN,
+				StreamID:       info.Stream,
+				StreamSequence: ssn,
+				PPID:           info.PPID,
+			},
+			flags: flags,
+			data:  data[off : off+n],
+		})
+		a.nextTSN++
+		off += n
+		if off == len(data) {
+			break
+		}
+	}
+	a.sndBufUsed += len(data)
+}
+
+// updateRTO updates the retransmission timeout with a round trip time
+// measurement, as described in RFC 9260 section 6.3.1.
+func (a *association) updateRTO(r time.Duration) {
+	if a.srtt == 0 {
+		a.srtt = r
+		a.rttvar = r / 2
+	} else {
+		diff := a.srtt - r
+		if diff < 0 {
+			diff = -diff
+		}
+		a.rttvar = (3*a.rttvar + diff) / 4
+		a.srtt = (7*a.srtt + r) / 8
+	}
+	a.rto = a.srtt + 4*a.rttvar
+	if a.rto < rtoMin {
+		a.rto = rtoMin
+	}
+	if a.rto > rtoMax {
+		a.rto = rtoMax
+	}
+}
+
+// backoff doubles the retransmission timeout, up to limit.
+func (a *association) backoff(limit time.Duration) {
+	a.rto *= 2
+	if a.rto > limit {
+		a.rto = limit
+	}
+}
+
+// randomUint32 returns a random number from the stack's secure RNG.
+func (e *endpoint) randomUint32() uint32 {
+	var b [4]byte
+	if _, err := io.ReadFull(e.stack.SecureRNG(), b[:]); err != nil {
+		panic(fmt.Sprintf("failed to read from the secure RNG: %v", err))
+	}
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// randomTag returns a random, non-zero verification tag.
+func (e *endpoint) randomTag() uint32 {
+	for {
+		if v := e.randomUint32(); v != 0 {
+			return v
+		}
+	}
+}
+
+// rcvWndLocked returns the receive window to advertise to the peer.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) rcvWndLocked() uint32 {
+	n := int(e.ops.GetReceiveBufferSize()) - e.assoc.rcvBufUsed
+	if n < 0 {
+		return 0
+	}
+	return uint32(n)
+}
+
+// receivingData returns true if the peer may still send DATA chunks.
+func (s EndpointState) receivingData() bool {
+	return s == StateEstablished || s == StateShutdownPending || s == StateShutdownSent
+}
+
+// sendInitLocked sends the INIT chunk that starts the association handshake.
+//
+// Precondition: e.mu must be held and e.assoc must be initialized.
+func (e *endpoint) sendInitLocked() {
+	a := &e.assoc
+	f := header.SCTPInitFields{
+		InitiateTag:     a.localVTag,
+		ARwnd:           e.rcvWndLocked(),
+		OutboundStreams: e.initMsg.NumOutStreams,
+		InboundStreams:  e.initMsg.MaxInStreams,
+		InitialTSN:      a.nextTSN,
+	}
+	types := []byte{0, header.SCTPParamIPv4Address}
+	if e.NetProto == header.IPv6ProtocolNumber {
+		types = append(types, 0, header.SCTPParamIPv6Address)
+	}
+	value := header.SCTPAppendParam(f.Encode(), header.SCTPParamSupportedAddressTypes, types)
+	a.initChunk = header.SCTPAppendChunk(nil, header.SCTPChunkInit, 0, value)
+
+	// INIT chunks carry a zero verification tag.
+	e.queuePacketLocked(0, a.initChunk)
+	e.state = StateCookieWait
+	a.t1.start(a.rto)
+}
+
+// handlePacketLocked processes a packet received by an endpoint that has an
+// association.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handlePacketLocked(p packet) {
+	a := &e.assoc
+	first, _, ok := header.SCTPNextChunk(p.chunks)
+	if !ok {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return
+	}
+
+	// Verify the tag as described in RFC 9260 section 8.5.
+	vtag := p.hdr.VerificationTag()
+	switch first.Type() {
+	case header.SCTPChunkInit:
+		// Initialization collisions and association restarts (RFC 9260
+		// section 5.2) are not supported. The peer retransmits its INIT
+		// and eventually gives up.
+		return
+	case header.SCTPChunkAbort, header.SCTPChunkShutdownComplete:
+		if first.Flags()&header.SCTPFlagTagReflected != 0 {
+			if e.state == StateCookieWait || vtag != a.peerVTag {
+				return
+			}
+		} else if vtag != a.localVTag {
+			return
+		}
+	default:
+		if vtag != a.localVTag {
+			return
+		}
+	}
+
+	gotData := false
+	for b := p.chunks; len(b) != 0; {
+		c, rest, ok := header.SCTPNextChunk(b)
+		if !ok {
+			e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+			break
+		}
+		b = rest
+		if c.Type() == header.SCTPChunkData {
+			gotData = true
+		}
+		if !e.handleChunkLocked(c) {
+			break
+		}
+	}
+
+	if gotData && e.state.receivingData() {
+		a.sackPending++
+		if a.sackNow || a.sackPending >= 2 || e.state == StateShutdownSent {
+			e.sendSackLocked()
+		} else if !a.sackTimer.armed {
+			a.sackTimer.start(sackTimeout)
+		}
+	}
+}
+
+// handleChunkLocked processes a chunk received on the association. It
+// returns false if the rest of the packet must be discarded.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handleChunkLocked(c header.SCTPChunk) bool {
+	a := &e.assoc
+	switch c.Type() {
+	case header.SCTPChunkData:
+		if !e.state.receivingData() {
+			return true
+		}
+		return e.handleDataLocked(c)
+
+	case header.SCTPChunkInitAck:
+		if e.state == StateCookieWait {
+			e.handleInitAckLocked(c)
+		}
+		return false
+
+	case header.SCTPChunkSack:
+		if !e.state.connected() {
+			return true
+		}
+		return e.handleSackLocked(c)
+
+	case header.SCTPChunkHeartbeat:
+		if e.state.connected() {
+			e.queuePacketLocked(a.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkHeartbeatAck, 0, c.Value()))
+		}
+		return true
+
+	case header.SCTPChunkHeartbeatAck:
+		// Heartbeats are never sent, so there is nothing to do.
+		return true
+
+	case header.SCTPChunkAbort:
+		if e.state.connecting() {
+			e.hardError = &tcpip.ErrConnectionRefused{}
+		} else {
+			e.hardError = &tcpip.ErrConnectionReset{}
+		}
+		e.cleanupLocked()
+		return false
+
+	case header.SCTPChunkShutdown:
+		if !e.state.connected() {
+			return true
+		}
+		return e.handleShutdownLocked(c)
+
+	case header.SCTPChunkShutdownAck:
+		if e.state == StateShutdownSent || e.state == StateShutdownAckSent {
+			e.queuePacketLocked(a.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkShutdownComplete, 0, nil))
+			e.cleanupLocked()
+		}
+		return false
+
+	case header.SCTPChunkError:
+		e.handleErrorLocked(c)
+		return e.state != StateClosed
+
+	case header.SCTPChunkCookieEcho:
+		// The peer did not receive our COOKIE ACK.
+		if e.state.connected() {
+			e.queuePacketLocked(a.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkCookieAck, 0, nil))
+		}
+		return true
+
+	case header.SCTPChunkCookieAck:
+		if e.state == StateCookieEchoed {
+			a.t1.stop()
+			a.rto = rtoInitial
+			e.state = StateEstablished
+			e.notifyLocked(waiter.WritableEvents)
+		}
+		return true
+
+	case header.SCTPChunkShutdownComplete:
+		if e.state == StateShutdownAckSent {
+			e.cleanupLocked()
+		}
+		return false
+
+	default:
+		return e.handleUnrecognizedChunkLocked(c)
+	}
+}
+
+// handleUnrecognizedChunkLocked acts on a chunk of unknown type according to
+// the two high bits of its type (RFC 9260 section 3.2). It returns false if
+// the rest of the packet must be discarded.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handleUnrecognizedChunkLocked(c header.SCTPChunk) bool {
+	if c.Type()&0x40 != 0 && e.state.connected() {
+		cause := header.SCTPAppendParam(nil, header.SCTPCauseUnrecognizedChunk, c[:c.Length()])
+		e.queuePacketLocked(e.assoc.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkError, 0, cause))
+	}
+	return c.Type()&0x80 != 0
+}
+
+// handleInitAckLocked processes the INIT ACK chunk that answers our INIT.
+//
+// Precondition: e.mu must be held and e.state must be StateCookieWait.
+func (e *endpoint) handleInitAckLocked(c header.SCTPChunk) {
+	a := &e.assoc
+	init := header.SCTPInit(c.Value())
+	if len(init) < header.SCTPInitHeaderSize-header.SCTPChunkHeaderSize || init.InitiateTag() == 0 || init.OutboundStreams() == 0 || init.InboundStreams() == 0 {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return
+	}
+	var cookie []byte
+	for params := init.Params(); len(params) != 0; {
+		typ, value, rest, ok := header.SCTPNextParam(params)
+		if !ok {
+			e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+			return
+		}
+		params = rest
+		if typ == header.SCTPParamStateCookie {
+			cookie = value
+		}
+	}
+	if cookie == nil {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return
+	}
+
+	a.peerVTag = init.InitiateTag()
+	a.peerRwnd = init.ARwnd()
+	a.ssthresh = a.peerRwnd
+	a.outStreams = e.initMsg.NumOutStreams
+	if n := init.InboundStreams(); n < a.outStreams {
+		a.outStreams = n
+	}
+	a.inStreams = e.initMsg.MaxInStreams
+	if n := init.OutboundStreams(); n < a.inStreams {
+		a.inStreams = n
+	}
+	a.rcvCumTSN = init.InitialTSN() - 1
+
+	a.cookieEcho = header.SCTPAppendChunk(nil, header.SCTPChunkCookieEcho, 0, cookie)
+	e.queuePacketLocked(a.peerVTag, a.cookieEcho)
+	e.state = StateCookieEchoed
+	a.initRetries = 0
+	a.t1.start(a.rto)
+}
+
+// handleErrorLocked processes an ERROR chunk. Only Stale Cookie errors, which
+// restart the handshake, are acted upon.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handleErrorLocked(c header.SCTPChunk) {
+	if e.state != StateCookieEchoed {
+		return
+	}
+	for causes := c.Value(); len(causes) != 0; {
+		typ, _, rest, ok := header.SCTPNextParam(causes)
+		if !ok {
+			return
+		}
+		causes = rest
+		if typ == header.SCTPCauseStaleCookie {
+			a := &e.assoc
+			a.initRetries++
+			if a.initRetries > int(e.initMsg.MaxAttempts) {
+				e.terminateLocked(&tcpip.ErrConnectionRefused{})
+				return
+			}
+			e.queuePacketLocked(0, a.initChunk)
+			e.state = StateCookieWait
+			a.t1.start(a.rto)
+			return
+		}
+	}
+}
+
+// handleDataLocked processes a DATA chunk. It returns false if the rest of
+// the packet must be discarded.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handleDataLocked(c header.SCTPChunk) bool {
+	a := &e.assoc
+	d := header.SCTPData(c.Value())
+	if len(d) < header.SCTPDataHeaderSize-header.SCTPChunkHeaderSize {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return false
+	}
+	tsn := d.TSN()
+	if len(d.Payload()) == 0 {
+		// RFC 9260 section 6.2: a DATA chunk without user data aborts the
+		// association.
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], tsn)
+		e.hardError = &tcpip.ErrConnectionAborted{}
+		e.abortLocked(header.SCTPAppendParam(nil, header.SCTPCauseNoUserData, b[:]))
+		return false
+	}
+
+	if _, ok := a.rcvGaps[tsn]; ok || !tsnLT(a.rcvCumTSN, tsn) {
+		if len(a.rcvDups) < maxDupTSNs {
+			a.rcvDups = append(a.rcvDups, tsn)
+		}
+		a.sackNow = true
+		return true
+	}
+	if tsn-a.rcvCumTSN > maxTSNWindow {
+		return true
+	}
+
+	sid := d.StreamID()
+	if sid >= a.inStreams {
+		// The TSN is acknowledged, but the data is dropped (RFC 9260
+		// section 6.5).
+		cause := header.SCTPAppendParam(nil, header.SCTPCauseInvalidStream, []byte{byte(sid >> 8), byte(sid), 0, 0})
+		e.queuePacketLocked(a.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkError, 0, cause))
+		a.recordTSN(tsn)
+		a.sackNow = true
+		return true
+	}
+
+	payload := d.Payload()
+	if a.rcvBufUsed+len(payload) > int(e.ops.GetReceiveBufferSize()) {
+		// Without room for the chunk, it is dropped and retransmitted by
+		// the peer once the window opens. When nothing is readable, the
+		// next chunk in sequence is accepted regardless so that messages
+		// larger than the receive buffer can be reassembled.
+		if len(a.rcvQueue) != 0 || tsn != a.rcvCumTSN+1 {
+			e.stats.ReceiveErrors.ReceiveBufferOverflow.Increment()
+			a.sackNow = true
+			return true
+		}
+	}
+
+	if tsn != a.rcvCumTSN+1 {
+		a.sackNow = true
+	}
+	a.recordTSN(tsn)
+	if len(a.rcvGaps) != 0 {
+		a.sackNow = true
+	}
+	a.rcvChunks[tsn] = &inChunk{
+		fields: header.SCTPDataFields{
+			TSN:            tsn,
+			StreamID:       sid,
+			StreamSequence: d.StreamSequence(),
+			PPID:           d.PPID(),
+		},
+		flags: c.Flags(),
+		data:  append([]byte(nil), payload...),
+	}
+	a.rcvBufUsed += len(payload)
+	e.reassembleLocked(tsn)
+	return true
+}
+
+// recordTSN records the receipt of the DATA chunk with TSN tsn.
+func (a *association) recordTSN(tsn uint32) {
+	if tsn != a.rcvCumTSN+1 {
+		a.rcvGaps[tsn] = struct{}{}
+		return
+	}
+	a.rcvCumTSN = tsn
+	for {
+		if _, ok := a.rcvGaps[a.rcvCumTSN+1]; !ok {
+			return
+		}
+		delete(a.rcvGaps, a.rcvCumTSN+1)
+		a.rcvCumTSN++
+	}
+}
+
+// reassembleLocked delivers the message that the DATA chunk with TSN tsn
+// belongs to if all of its fragments have been received.
+//
+// Precondition: e.mu must be held and a.rcvChunks must hold tsn.
+func (e *endpoint) reassembleLocked(tsn uint32) {
+	a := &e.assoc
+	sid := a.rcvChunks[tsn].fields.StreamID
+	first := tsn
+	for a.rcvChunks[first].flags&header.SCTPDataFlagBeginning == 0 {
+		prev, ok := a.rcvChunks[first-1]
+		if !ok || prev.fields.StreamID != sid || prev.flags&header.SCTPDataFlagEnd != 0 {
+			return
+		}
+		first--
+	}
+	last := tsn
+	for a.rcvChunks[last].flags&header.SCTPDataFlagEnd == 0 {
+		next, ok := a.rcvChunks[last+1]
+		if !ok || next.fields.StreamID != sid || next.flags&header.SCTPDataFlagBeginning != 0 {
+			return
+		}
+		last++
+	}
+
+	b := a.rcvChunks[first]
+	m := &message{
+		data: b.data,
+		info: tcpip.SCTPSndRcvInfo{
+			Stream:    sid,
+			SSN:       b.fields.StreamSequence,
+			Unordered: b.flags&header.SCTPDataFlagUnordered != 0,
+			PPID:      b.fields.PPID,
+			TSN:       first,
+			CumTSN:    a.rcvCumTSN,
+		},
+	}
+	if first != last {
+		size := 0
+		for t := first; ; t++ {
+			size += len(a.rcvChunks[t].data)
+			if t == last {
+				break
+			}
+		}
+		m.data = make([]byte, 0, size)
+	}
+	for t := first; ; t++ {
+		if first != last {
+			m.data = append(m.data, a.rcvChunks[t].data...)
+		}
+		delete(a.rcvChunks, t)
+		if t == last {
+			break
+		}
+	}
+	e.deliverLocked(m)
+}
+
+// deliverLocked makes a received message readable, holding back ordered
+// messages that arrive ahead of their turn.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) deliverLocked(m *message) {
+	a := &e.assoc
+	if m.info.Unordered {
+		e.enqueueLocked(m)
+		return
+	}
+	s, ok := a.rcvStreams[m.info.Stream]
+	if !ok {
+		s = &inStream{}
+		a.rcvStreams[m.info.Stream] = s
+	}
+	if m.info.SSN != s.nextSSN {
+		if s.held == nil {
+			s.held = make(map[uint16]*message)
+		}
+		s.held[m.info.SSN] = m
+		return
+	}
+	for {
+		e.enqueueLocked(m)
+		s.nextSSN++
+		next, ok := s.held[s.nextSSN]
+		if !ok {
+			return
+		}
+		delete(s.held, s.nextSSN)
+		m = next
+	}
+}
+
+// enqueueLocked appends m to the receive queue.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) enqueueLocked(m *message) {
+	a := &e.assoc
+	if a.rcvClosed {
+		a.rcvBufUsed -= len(m.data)
+		return
+	}
+	a.rcvQueue = append(a.rcvQueue, m)
+	e.notifyLocked(waiter.ReadableEvents)
+}
+
+// sendSackLocked sends a SACK chunk acknowledging the received DATA chunks.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) sendSackLocked() {
+	a := &e.assoc
+	var gaps []header.SCTPGapBlock
+	if len(a.rcvGaps) != 0 {
+		offsets := make([]uint32, 0, len(a.rcvGaps))
+		for tsn := range a.rcvGaps {
+			offsets = append(offsets, tsn-a.rcvCumTSN)
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		for _, off := range offsets {
+			if n := len(gaps); n != 0 && uint32(gaps[n-1].End)+1 == off {
+				gaps[n-1].End++
+				continue
+			}
+			if len(gaps) == maxGapBlocks {
+				break
+			}
+			gaps = append(gaps, header.SCTPGapBlock{Start: uint16(off), End: uint16(off)})
+		}
+	}
+	rwnd := e.rcvWndLocked()
+	sack := header.SCTPEncodeSack(a.rcvCumTSN, rwnd, gaps, a.rcvDups)
+	e.queuePacketLocked(a.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkSack, 0, sack))
+	a.rcvDups = nil
+	a.sackPending = 0
+	a.sackNow = false
+	a.sackTimer.stop()
+	a.lastAdvertisedRwnd = rwnd
+}
+
+// maybeSendWindowUpdateLocked sends a SACK advertising the receive window if
+// it has opened significantly since it was last advertised.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) maybeSendWindowUpdateLocked() {
+	if !e.state.receivingData() {
+		return
+	}
+	a := &e.assoc
+	rwnd := e.rcvWndLocked()
+	if rwnd <= a.lastAdvertisedRwnd {
+		return
+	}
+	if rwnd-a.lastAdvertisedRwnd >= uint32(e.ops.GetReceiveBufferSize())/4 || (a.lastAdvertisedRwnd < a.mtu && rwnd >= a.mtu) {
+		e.sendSackLocked()
+	}
+}
+
+// handleSackLocked processes a SACK chunk. It returns false if the rest of
+// the packet must be discarded.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handleSackLocked(c header.SCTPChunk) bool {
+	a := &e.assoc
+	s := header.SCTPSack(c.Value())
+	if !s.Valid() {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return false
+	}
+	cum := s.CumulativeTSNAck()
+	if tsnLT(cum, a.cumAckPoint) {
+		// The SACK is older than one already processed.
+		return true
+	}
+	if !tsnLT(cum, a.nextTSN) {
+		// The peer acknowledged data that was never sent.
+		e.hardError = &tcpip.ErrConnectionAborted{}
+		e.abortLocked(header.SCTPAppendParam(nil, header.SCTPCauseProtocolViolation, nil))
+		return false
+	}
+
+	advanced := cum != a.cumAckPoint
+	bytesAcked := e.ackCumulativeLocked(cum)
+
+	// Mark the chunks covered by gap ack blocks. A chunk that is no longer
+	// covered has been reneged on by the peer.
+	highest := cum
+	blocks := s.NumGapBlocks()
+	for _, ch := range a.sndQueue {
+		off := ch.fields.TSN - cum
+		acked := false
+		for i := 0; i < blocks; i++ {
+			if start, end := s.GapBlock(i); off >= uint32(start) && off <= uint32(end) {
+				acked = true
+				break
+			}
+		}
+		if acked {
+			if !ch.acked {
+				bytesAcked += uint32(len(ch.data))
+			}
+			ch.retransmit = false
+			highest = ch.fields.TSN
+		}
+		ch.acked = acked
+	}
+
+	// Chunks reported missing by three SACKs are fast retransmitted (RFC
+	// 9260 section 7.2.4).
+	fastRetransmit := false
+	for _, ch := range a.sndQueue {
+		if !tsnLT(ch.fields.TSN, highest) {
+			break
+		}
+		if ch.sent && !ch.acked && !ch.retransmit {
+			ch.missed++
+			if ch.missed >= 3 {
+				ch.retransmit = true
+				fastRetransmit = true
+			}
+		}
+	}
+	if fastRetransmit && !a.fastRecovery {
+		a.ssthresh = a.cwnd / 2
+		if a.ssthresh < 4*a.mtu {
+			a.ssthresh = 4 * a.mtu
+		}
+		a.cwnd = a.ssthresh
+		a.partialBytesAcked = 0
+		a.fastRecovery = true
+		a.recoverTSN = a.nextTSN - 1
+	}
+	if a.fastRecovery && !tsnLT(cum, a.recoverTSN) {
+		a.fastRecovery = false
+	}
+
+	if advanced {
+		a.errorCount = 0
+		if !a.fastRecovery {
+			if a.cwnd <= a.ssthresh {
+				// Slow start.
+				inc := bytesAcked
+				if inc > a.mtu {
+					inc = a.mtu
+				}
+				a.cwnd += inc
+			} else {
+				// Congestion avoidance.
+				a.partialBytesAcked += bytesAcked
+				if a.partialBytesAcked >= a.cwnd {
+					a.partialBytesAcked -= a.cwnd
+					a.cwnd += a.mtu
+				}
+			}
+		}
+	}
+
+	flight := uint32(a.flightSize())
+	if rwnd := s.ARwnd(); rwnd > flight {
+		a.peerRwnd = rwnd - flight
+	} else {
+		a.peerRwnd = 0
+	}
+	if flight == 0 {
+		a.t3.stop()
+	} else if advanced {
+		a.t3.start(a.rto)
+	}
+
+	e.transmitLocked()
+	e.checkShutdownLocked()
+	return true
+}
+
+// ackCumulativeLocked removes the DATA chunks up to and including TSN cum
+// from the send queue. It returns the number of bytes newly acknowledged.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) ackCumulativeLocked(cum uint32) uint32 {
+	a := &e.assoc
+	a.cumAckPoint = cum
+	n := 0
+	var acked uint32
+	freed := 0
+	for _, ch := range a.sndQueue {
+		if tsnLT(cum, ch.fields.TSN) {
+			break
+		}
+		if !ch.acked {
+			acked += uint32(len(ch.data))
+		}
+		freed += len(ch.data)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	if a.rttPending && !tsnLT(cum, a.rttTSN) {
+		a.rttPending = false
+		a.updateRTO(e.stack.Clock().NowMonotonic().Sub(a.rttStart))
+	}
+	copy(a.sndQueue, a.sndQueue[n:])
+	for i := len(a.sndQueue) - n; i < len(a.sndQueue); i++ {
+		a.sndQueue[i] = nil
+	}
+	a.sndQueue = a.sndQueue[:len(a.sndQueue)-n]
+	a.sndBufUsed -= freed
+	e.notifyLocked(waiter.WritableEvents)
+	return acked
+}
+
+// transmitLocked sends the DATA chunks permitted by the congestion and
+// receive windows, retransmissions first, bundling as many as fit in each
+// packet.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) transmitLocked() {
+	switch e.state {
+	case StateEstablished, StateShutdownPending, StateShutdownReceived:
+	default:
+		return
+	}
+
+	a := &e.assoc
+	maxSize := int(a.mtu) - header.SCTPMinimumSize
+	flight := a.flightSize()
+	delay := e.ops.GetDelayOption()
+	unsent := 0
+	for _, ch := range a.sndQueue {
+		if !ch.sent {
+			unsent += len(ch.data)
+		}
+	}
+	now := e.stack.Clock().NowMonotonic()
+
+	var chunks []byte
+loop:
+	for _, retransmit := range []bool{true, false} {
+		for _, ch := range a.sndQueue {
+			if retransmit != ch.retransmit || (!retransmit && ch.sent) {
+				continue
+			}
+			if flight != 0 && flight+len(ch.data) > int(a.cwnd) {
+				break loop
+			}
+			if !ch.sent {
+				// New data is limited by the peer's receive window, but
+				// a single chunk may probe a closed window when nothing
+				// is outstanding.
+				if flight != 0 && uint32(len(ch.data)) > a.peerRwnd {
+					break loop
+				}
+				// Small messages are held back while data is
+				// outstanding, unless SCTP_NODELAY is set.
+				if delay && flight != 0 && unsent < a.fragPoint() {
+					break loop
+				}
+			}
+
+			size := (header.SCTPDataHeaderSize + len(ch.data) + 3) &^ 3
+			if len(chunks) != 0 && len(chunks)+size > maxSize {
+				e.queuePacketLocked(a.peerVTag, chunks)
+				chunks = nil
+			}
+			chunks = header.SCTPAppendData(chunks, ch.flags, ch.fields, ch.data)
+
+			if ch.sent {
+				ch.retransmitted = true
+				if a.rttPending && a.rttTSN == ch.fields.TSN {
+					a.rttPending = false
+				}
+			} else {
+				unsent -= len(ch.data)
+				if !a.rttPending {
+					a.rttPending = true
+					a.rttTSN = ch.fields.TSN
+					a.rttStart = now
+				}
+			}
+			ch.sent = true
+			ch.retransmit = false
+			ch.missed = 0
+			flight += len(ch.data)
+			if n := uint32(len(ch.data)); n < a.peerRwnd {
+				a.peerRwnd -= n
+			} else {
+				a.peerRwnd = 0
+			}
+		}
+	}
+	if len(chunks) != 0 {
+		e.queuePacketLocked(a.peerVTag, chunks)
+		if !a.t3.armed {
+			a.t3.start(a.rto)
+		}
+	}
+}
+
+// startShutdownLocked starts a graceful shutdown of the association, which
+// completes once all queued data has been acknowledged.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) startShutdownLocked() {
+	if e.state != StateEstablished {
+		return
+	}
+	e.state = StateShutdownPending
+	e.notifyLocked(waiter.WritableEvents)
+	e.checkShutdownLocked()
+}
+
+// checkShutdownLocked sends the SHUTDOWN or SHUTDOWN ACK chunk once all
+// queued data has been acknowledged.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) checkShutdownLocked() {
+	a := &e.assoc
+	if len(a.sndQueue) != 0 {
+		return
+	}
+	switch e.state {
+	case StateShutdownPending:
+		e.queuePacketLocked(a.peerVTag, e.shutdownChunkLocked())
+		e.state = StateShutdownSent
+		a.t2.start(a.rto)
+	case StateShutdownReceived:
+		e.queuePacketLocked(a.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkShutdownAck, 0, nil))
+		e.state = StateShutdownAckSent
+		a.t2.start(a.rto)
+	}
+}
+
+// shutdownChunkLocked returns a SHUTDOWN chunk.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) shutdownChunkLocked() []byte {
+	var b [header.SCTPShutdownSize - header.SCTPChunkHeaderSize]byte
+	binary.BigEndian.PutUint32(b[:], e.assoc.rcvCumTSN)
+	return header.SCTPAppendChunk(nil, header.SCTPChunkShutdown, 0, b[:])
+}
+
+// handleShutdownLocked processes a SHUTDOWN chunk. It returns false if the
+// rest of the packet must be discarded.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handleShutdownLocked(c header.SCTPChunk) bool {
+	a := &e.assoc
+	v := c.Value()
+	if len(v) < header.SCTPShutdownSize-header.SCTPChunkHeaderSize {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return false
+	}
+	if cum := binary.BigEndian.Uint32(v); !tsnLT(cum, a.cumAckPoint) && tsnLT(cum, a.nextTSN) {
+		e.ackCumulativeLocked(cum)
+		if a.flightSize() == 0 {
+			a.t3.stop()
+		}
+	}
+
+	switch e.state {
+	case StateEstablished, StateShutdownPending:
+		e.state = StateShutdownReceived
+		e.notifyLocked(waiter.ReadableEvents | waiter.WritableEvents)
+		e.checkShutdownLocked()
+	case StateShutdownSent, StateShutdownAckSent:
+		// Both ends are shutting down, or the peer did not receive our
+		// SHUTDOWN ACK.
+		e.queuePacketLocked(a.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkShutdownAck, 0, nil))
+		if e.state == StateShutdownSent {
+			e.state = StateShutdownAckSent
+			e.notifyLocked(waiter.ReadableEvents)
+		}
+		a.t2.start(a.rto)
+	}
+	return true
+}
+
+// onT1Locked retransmits the INIT or COOKIE ECHO chunk.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) onT1Locked() {
+	a := &e.assoc
+	a.initRetries++
+	if a.initRetries > int(e.initMsg.MaxAttempts) {
+		e.terminateLocked(&tcpip.ErrTimeout{})
+		return
+	}
+	a.backoff(e.initMsg.MaxInitTimeout)
+	switch e.state {
+	case StateCookieWait:
+		e.queuePacketLocked(0, a.initChunk)
+	case StateCookieEchoed:
+		e.queuePacketLocked(a.peerVTag, a.cookieEcho)
+	default:
+		return
+	}
+	a.t1.start(a.rto)
+}
+
+// onT2Locked retransmits the SHUTDOWN or SHUTDOWN ACK chunk.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) onT2Locked() {
+	a := &e.assoc
+	a.errorCount++
+	if a.errorCount > maxAssocRetransmits {
+		e.terminateLocked(&tcpip.ErrTimeout{})
+		return
+	}
+	a.backoff(rtoMax)
+	switch e.state {
+	case StateShutdownSent:
+		e.queuePacketLocked(a.peerVTag, e.shutdownChunkLocked())
+	case StateShutdownAckSent:
+		e.queuePacketLocked(a.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkShutdownAck, 0, nil))
+	default:
+		return
+	}
+	a.t2.start(a.rto)
+}
+
+// onT3Locked retransmits outstanding DATA chunks (RFC 9260 section 6.3.3).
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) onT3Locked() {
+	a := &e.assoc
+	a.errorCount++
+	if a.errorCount > maxAssocRetransmits {
+		e.terminateLocked(&tcpip.ErrTimeout{})
+		return
+	}
+	a.ssthresh = a.cwnd / 2
+	if a.ssthresh < 4*a.mtu {
+		a.ssthresh = 4 * a.mtu
+	}
+	a.cwnd = a.mtu
+	a.partialBytesAcked = 0
+	a.fastRecovery = false
+	a.rttPending = false
+	a.backoff(rtoMax)
+	for _, ch := range a.sndQueue {
+		if ch.sent && !ch.acked {
+			ch.retransmit = true
+		}
+	}
+	e.transmitLocked()
+}
+
+// onSackTimerLocked sends a delayed SACK.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) onSackTimerLocked() {
+	if e.assoc.sackPending != 0 && e.state.receivingData() {
+		e.sendSackLocked()
+	}
+}
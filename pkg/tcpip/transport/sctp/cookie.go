@@ -0,0 +1,116 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// cookieSecretSize is the size of the key used to sign state cookies.
+const cookieSecretSize = 32
+
+// cookieFixedSize is the size of the fixed-length fields of an encoded
+// stateCookie.
+const cookieFixedSize = 8 + 4*5 + 2*4
+
+// stateCookie holds the parameters of an association that a listening
+// endpoint places in the State Cookie of an INIT ACK chunk, so that no state
+// is kept until the peer echoes the cookie back in a COOKIE ECHO chunk (RFC
+// 9260 section 5.1.3).
+type stateCookie struct {
+	// created is the time at which the cookie was issued, in nanoseconds
+	// since the Unix epoch.
+	created int64
+
+	localVTag uint32
+	peerVTag  uint32
+	localTSN  uint32
+	peerTSN   uint32
+	peerRwnd  uint32
+
+	outStreams uint16
+	inStreams  uint16
+
+	localPort uint16
+	peerPort  uint16
+	localAddr tcpip.Address
+	peerAddr  tcpip.Address
+}
+
+// encode returns the cookie signed with secret.
+func (c *stateCookie) encode(secret []byte) []byte {
+	b := make([]byte, cookieFixedSize, cookieFixedSize+2+len(c.localAddr)+len(c.peerAddr)+sha256.Size)
+	binary.BigEndian.PutUint64(b[0:], uint64(c.created))
+	binary.BigEndian.PutUint32(b[8:], c.localVTag)
+	binary.BigEndian.PutUint32(b[12:], c.peerVTag)
+	binary.BigEndian.PutUint32(b[16:], c.localTSN)
+	binary.BigEndian.PutUint32(b[20:], c.peerTSN)
+	binary.BigEndian.PutUint32(b[24:], c.peerRwnd)
+	binary.BigEndian.PutUint16(b[28:], c.outStreams)
+	binary.BigEndian.PutUint16(b[30:], c.inStreams)
+	binary.BigEndian.PutUint16(b[32:], c.localPort)
+	binary.BigEndian.PutUint16(b[34:], c.peerPort)
+	b = append(b, byte(len(c.localAddr)))
+	b = append(b, c.localAddr...)
+	b = append(b, byte(len(c.peerAddr)))
+	b = append(b, c.peerAddr...)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(b)
+	return mac.Sum(b)
+}
+
+// decodeCookie verifies that b was produced by stateCookie.encode with
+// secret and returns the cookie it holds.
+func decodeCookie(b []byte, secret []byte) (stateCookie, bool) {
+	if len(b) < cookieFixedSize+2+sha256.Size {
+		return stateCookie{}, false
+	}
+	body, sum := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return stateCookie{}, false
+	}
+
+	c := stateCookie{
+		created:    int64(binary.BigEndian.Uint64(body[0:])),
+		localVTag:  binary.BigEndian.Uint32(body[8:]),
+		peerVTag:   binary.BigEndian.Uint32(body[12:]),
+		localTSN:   binary.BigEndian.Uint32(body[16:]),
+		peerTSN:    binary.BigEndian.Uint32(body[20:]),
+		peerRwnd:   binary.BigEndian.Uint32(body[24:]),
+		outStreams: binary.BigEndian.Uint16(body[28:]),
+		inStreams:  binary.BigEndian.Uint16(body[30:]),
+		localPort:  binary.BigEndian.Uint16(body[32:]),
+		peerPort:   binary.BigEndian.Uint16(body[34:]),
+	}
+	addrs := body[cookieFixedSize:]
+	n := int(addrs[0])
+	if len(addrs) < 1+n+1 {
+		return stateCookie{}, false
+	}
+	c.localAddr = tcpip.Address(addrs[1 : 1+n])
+	addrs = addrs[1+n:]
+	n = int(addrs[0])
+	if len(addrs) != 1+n {
+		return stateCookie{}, false
+	}
+	c.peerAddr = tcpip.Address(addrs[1:])
+	return c, true
+}
@@ -0,0 +1,966 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"fmt"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/ports"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// EndpointState represents the state of an SCTP endpoint. The association
+// states are those of RFC 9260 section 4.
+type EndpointState tcpip.EndpointState
+
+// SCTP endpoint states.
+const (
+	StateInitial EndpointState = iota
+	StateBound
+	StateListen
+	StateCookieWait
+	StateCookieEchoed
+	StateEstablished
+	StateShutdownPending
+	StateShutdownSent
+	StateShutdownReceived
+	StateShutdownAckSent
+	StateClosed
+)
+
+// connected returns true if the endpoint has an established association,
+// including one that is being shut down.
+func (s EndpointState) connected() bool {
+	return s >= StateEstablished && s <= StateShutdownAckSent
+}
+
+// connecting returns true if the endpoint is performing the association
+// handshake.
+func (s EndpointState) connecting() bool {
+	return s == StateCookieWait || s == StateCookieEchoed
+}
+
+// String implements fmt.Stringer.String.
+func (s EndpointState) String() string {
+	switch s {
+	case StateInitial:
+		return "INITIAL"
+	case StateBound:
+		return "BOUND"
+	case StateListen:
+		return "LISTEN"
+	case StateCookieWait:
+		return "COOKIE-WAIT"
+	case StateCookieEchoed:
+		return "COOKIE-ECHOED"
+	case StateEstablished:
+		return "ESTABLISHED"
+	case StateShutdownPending:
+		return "SHUTDOWN-PENDING"
+	case StateShutdownSent:
+		return "SHUTDOWN-SENT"
+	case StateShutdownReceived:
+		return "SHUTDOWN-RECEIVED"
+	case StateShutdownAckSent:
+		return "SHUTDOWN-ACK-SENT"
+	case StateClosed:
+		return "CLOSED"
+	default:
+		panic(fmt.Sprintf("unknown state %d", s))
+	}
+}
+
+// endpoint represents an SCTP endpoint. It implements tcpip.Endpoint and
+// stack.TransportEndpoint, and carries at most one association.
+//
+// All mutable fields are protected by mu. Packets generated while holding mu
+// are queued in outbox and written, along with any pending waiter
+// notifications, by unlockAndFlush.
+//
+// +stateify savable
+type endpoint struct {
+	stack.TransportEndpointInfo
+	tcpip.DefaultSocketOptionsHandler
+
+	// The following fields are initialized at creation time and do not
+	// change throughout the lifetime of the endpoint.
+	stack       *stack.Stack `state:"manual"`
+	waiterQueue *waiter.Queue
+	uniqueID    uint64
+
+	// ops is used to get socket level options.
+	ops tcpip.SocketOptions
+
+	// stats holds endpoint-level statistics.
+	stats tcpip.TransportEndpointStats
+
+	mu sync.Mutex `state:"nosave"`
+
+	state EndpointState
+
+	// hardError is the error that terminated the association, reported once
+	// by Connect, Read, Write or LastError.
+	hardError tcpip.Error
+
+	lastErrorMu sync.Mutex `state:"nosave"`
+	lastError   tcpip.Error
+
+	// connectNotified is set once a successful Connect has been reported to
+	// the caller.
+	connectNotified bool
+
+	// closed is set by Close. A closed endpoint with an association that is
+	// shutting down gracefully is released once the shutdown completes.
+	closed bool
+
+	portFlags          ports.Flags
+	portRes            ports.Reservation `state:"nosave"`
+	isPortReserved     bool              `state:"nosave"`
+	isRegistered       bool              `state:"nosave"`
+	effectiveNetProtos []tcpip.NetworkProtocolNumber
+	bindToDevice       tcpip.NICID
+
+	// route is the route to the peer of the association.
+	route *stack.Route `state:"nosave"`
+
+	ttl     uint8
+	tos     uint8
+	initMsg tcpip.SCTPInitMsgOption
+	events  tcpip.SCTPEventsOption
+
+	// The following fields are used by listening endpoints.
+	backlog      int
+	acceptQueue  []*endpoint `state:"nosave"`
+	cookieSecret []byte      `state:"nosave"`
+
+	// assoc holds the state of the association.
+	assoc association `state:"nosave"`
+
+	outbox        []outPacket      `state:"nosave"`
+	pendingEvents waiter.EventMask `state:"nosave"`
+}
+
+func newEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) *endpoint {
+	e := &endpoint{
+		stack: s,
+		TransportEndpointInfo: stack.TransportEndpointInfo{
+			NetProto:   netProto,
+			TransProto: ProtocolNumber,
+		},
+		waiterQueue: waiterQueue,
+		uniqueID:    s.UniqueID(),
+		initMsg: tcpip.SCTPInitMsgOption{
+			NumOutStreams:  defaultOutStreams,
+			MaxInStreams:   defaultMaxInStreams,
+			MaxAttempts:    maxInitRetransmits,
+			MaxInitTimeout: rtoMax,
+		},
+	}
+	e.ops.InitHandler(e, e.stack, tcpip.GetStackSendBufferLimits, tcpip.GetStackReceiveBufferLimits)
+	e.ops.SetSendBufferSize(DefaultSendBufferSize, false /* notify */)
+	e.ops.SetReceiveBufferSize(DefaultReceiveBufferSize, false /* notify */)
+	e.ops.SetMulticastLoop(true)
+	return e
+}
+
+// notifyLocked records events to be delivered to waiters by unlockAndFlush.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) notifyLocked(mask waiter.EventMask) {
+	e.pendingEvents |= mask
+}
+
+// unlockAndFlush releases e.mu, then writes the packets queued while it was
+// held and notifies waiters of pending events.
+func (e *endpoint) unlockAndFlush() {
+	outbox := e.outbox
+	e.outbox = nil
+	events := e.pendingEvents
+	e.pendingEvents = 0
+	e.mu.Unlock()
+
+	for i := range outbox {
+		if err := outbox[i].send(); err != nil {
+			e.stats.SendErrors.SendToNetworkFailed.Increment()
+			continue
+		}
+		e.stats.PacketsSent.Increment()
+	}
+	if events != 0 {
+		e.waiterQueue.Notify(events)
+	}
+}
+
+// queuePacketLocked queues a packet carrying chunks to the association's
+// peer.
+//
+// Precondition: e.mu must be held and e.route must be set.
+func (e *endpoint) queuePacketLocked(vtag uint32, chunks []byte) {
+	e.route.Acquire()
+	e.outbox = append(e.outbox, outPacket{
+		route:   e.route,
+		srcPort: e.ID.LocalPort,
+		dstPort: e.ID.RemotePort,
+		vtag:    vtag,
+		chunks:  chunks,
+		ttl:     e.ttl,
+		tos:     e.tos,
+	})
+}
+
+// UniqueID implements stack.TransportEndpoint.UniqueID.
+func (e *endpoint) UniqueID() uint64 {
+	return e.uniqueID
+}
+
+// LastError implements tcpip.Endpoint.LastError.
+func (e *endpoint) LastError() tcpip.Error {
+	e.mu.Lock()
+	err := e.hardError
+	e.hardError = nil
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	e.lastErrorMu.Lock()
+	defer e.lastErrorMu.Unlock()
+	err = e.lastError
+	e.lastError = nil
+	return err
+}
+
+// UpdateLastError implements tcpip.SocketOptionsHandler.UpdateLastError.
+func (e *endpoint) UpdateLastError(err tcpip.Error) {
+	e.lastErrorMu.Lock()
+	e.lastError = err
+	e.lastErrorMu.Unlock()
+}
+
+// HasNIC implements tcpip.SocketOptionsHandler.HasNIC.
+func (e *endpoint) HasNIC(id int32) bool {
+	return id == 0 || e.stack.HasNIC(tcpip.NICID(id))
+}
+
+// OnDelayOptionSet implements tcpip.SocketOptionsHandler.OnDelayOptionSet.
+func (e *endpoint) OnDelayOptionSet(v bool) {
+	if v {
+		return
+	}
+	// Disabling the Nagle-like delay (SCTP_NODELAY) flushes any data that
+	// was being held back.
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+	if e.state.connected() {
+		e.transmitLocked()
+	}
+}
+
+// WakeupWriters implements tcpip.SocketOptionsHandler.WakeupWriters.
+func (e *endpoint) WakeupWriters() {
+	e.waiterQueue.Notify(waiter.WritableEvents)
+}
+
+// Abort implements stack.TransportEndpoint.Abort.
+func (e *endpoint) Abort() {
+	e.mu.Lock()
+	queued := e.abortLocked(nil)
+	e.unlockAndFlush()
+	for _, n := range queued {
+		n.Abort()
+	}
+}
+
+// Close implements tcpip.Endpoint.Close. An established association is shut
+// down gracefully unless there is unread data, in which case it is aborted as
+// on Linux.
+func (e *endpoint) Close() {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	e.ops.SetCorkOption(false)
+
+	var queued []*endpoint
+	switch {
+	case e.state.connected() && e.state != StateEstablished:
+		// Already shutting down; the endpoint is released once the
+		// shutdown completes.
+	case e.state == StateEstablished && len(e.assoc.rcvQueue) == 0 && !e.lingerAbortLocked():
+		e.startShutdownLocked()
+	default:
+		queued = e.abortLocked(nil)
+	}
+	e.unlockAndFlush()
+
+	// Connections that were never accepted are aborted.
+	for _, n := range queued {
+		n.Abort()
+	}
+}
+
+// lingerAbortLocked returns true if SO_LINGER is set with a zero timeout, in
+// which case Close aborts the association.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) lingerAbortLocked() bool {
+	l := e.ops.GetLinger()
+	return l.Enabled && l.Timeout == 0
+}
+
+// abortLocked aborts the association, if any, by sending an ABORT chunk that
+// carries cause, and releases the endpoint's resources. It returns the
+// endpoints in the accept queue of a listening endpoint, which the caller
+// must abort after releasing e.mu.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) abortLocked(cause []byte) []*endpoint {
+	if e.state.connected() || e.state == StateCookieEchoed {
+		e.queuePacketLocked(e.assoc.peerVTag, header.SCTPAppendChunk(nil, header.SCTPChunkAbort, 0, cause))
+	}
+	queued := e.acceptQueue
+	e.acceptQueue = nil
+	e.cleanupLocked()
+	return queued
+}
+
+// cleanupLocked moves the endpoint to the closed state and releases its
+// registration, port reservation, route and timers.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) cleanupLocked() {
+	e.assoc.stopTimers()
+	if e.isRegistered {
+		e.stack.UnregisterTransportEndpoint(e.effectiveNetProtos, ProtocolNumber, e.ID, e, e.portFlags, e.bindToDevice)
+		e.isRegistered = false
+	}
+	if e.isPortReserved {
+		e.stack.ReleasePort(e.portRes)
+		e.isPortReserved = false
+	}
+	if e.route != nil {
+		e.route.Release()
+		e.route = nil
+	}
+	e.state = StateClosed
+	e.notifyLocked(waiter.EventHUp | waiter.EventErr | waiter.ReadableEvents | waiter.WritableEvents)
+}
+
+// terminateLocked ends the association because of err, which is reported to
+// the user.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) terminateLocked(err tcpip.Error) {
+	e.hardError = err
+	queued := e.abortLocked(nil)
+	if len(queued) != 0 {
+		panic("only listening endpoints have an accept queue")
+	}
+}
+
+// Read implements tcpip.Endpoint.Read. Each read returns data from at most
+// one message; a read that consumes the end of a message sets EndOfRecord.
+func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult, tcpip.Error) {
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+
+	a := &e.assoc
+	if len(a.rcvQueue) == 0 {
+		if err := e.hardError; err != nil {
+			e.hardError = nil
+			return tcpip.ReadResult{}, err
+		}
+		switch {
+		case e.state == StateClosed, a.rcvClosed, e.state == StateShutdownReceived, e.state == StateShutdownAckSent:
+			return tcpip.ReadResult{}, &tcpip.ErrClosedForReceive{}
+		case e.state.connected():
+			return tcpip.ReadResult{}, &tcpip.ErrWouldBlock{}
+		default:
+			return tcpip.ReadResult{}, &tcpip.ErrNotConnected{}
+		}
+	}
+
+	m := a.rcvQueue[0]
+	n, err := dst.Write(m.data[m.off:])
+	if n == 0 && err != nil && len(m.data) != m.off {
+		return tcpip.ReadResult{}, &tcpip.ErrBadBuffer{}
+	}
+	res := tcpip.ReadResult{
+		Count:       n,
+		Total:       n,
+		EndOfRecord: m.off+n == len(m.data),
+	}
+	if e.events&tcpip.SCTPEventDataIO != 0 {
+		res.ControlMessages.HasSCTPSndRcvInfo = true
+		res.ControlMessages.SCTPSndRcvInfo = m.info
+	}
+	if !opts.Peek {
+		m.off += n
+		if m.off == len(m.data) {
+			a.rcvQueue[0] = nil
+			a.rcvQueue = a.rcvQueue[1:]
+		}
+		a.rcvBufUsed -= n
+		e.maybeSendWindowUpdateLocked()
+	}
+	return res, nil
+}
+
+// Write implements tcpip.Endpoint.Write. Each call sends one message: it is
+// either queued in its entirety or not at all.
+func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcpip.Error) {
+	if opts.More {
+		return 0, &tcpip.ErrInvalidOptionValue{}
+	}
+
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+
+	if err := e.hardError; err != nil {
+		e.hardError = nil
+		return 0, err
+	}
+	info := opts.ControlMessages.SCTPSndRcvInfo
+	if !opts.ControlMessages.HasSCTPSndRcvInfo {
+		info = tcpip.SCTPSndRcvInfo{}
+	}
+	switch {
+	case e.state == StateEstablished:
+	case e.state.connecting():
+		return 0, &tcpip.ErrWouldBlock{}
+	case e.state.connected(), e.state == StateClosed:
+		return 0, &tcpip.ErrClosedForSend{}
+	default:
+		return 0, &tcpip.ErrNotConnected{}
+	}
+
+	a := &e.assoc
+	if info.Stream >= a.outStreams {
+		return 0, &tcpip.ErrInvalidOptionValue{}
+	}
+
+	size := p.Len()
+	if size > int(e.ops.GetSendBufferSize()) {
+		return 0, &tcpip.ErrMessageTooLong{}
+	}
+	if a.sndBufUsed != 0 && a.sndBufUsed+size > int(e.ops.GetSendBufferSize()) {
+		return 0, &tcpip.ErrWouldBlock{}
+	}
+	data := make([]byte, size)
+	if n, err := io.ReadFull(p, data); err != nil {
+		if n == 0 {
+			return 0, &tcpip.ErrBadBuffer{}
+		}
+		data = data[:n]
+	}
+
+	if len(data) == 0 && !info.EOF && !info.Abort {
+		return 0, &tcpip.ErrInvalidOptionValue{}
+	}
+
+	if info.Abort {
+		// The message is carried to the peer as the reason for the abort.
+		cause := header.SCTPAppendParam(nil, header.SCTPCauseUserInitiatedAbort, data)
+		e.abortLocked(cause)
+		return int64(len(data)), nil
+	}
+
+	if len(data) != 0 {
+		a.queueMessage(data, info)
+	}
+	if info.EOF {
+		e.startShutdownLocked()
+	} else {
+		e.transmitLocked()
+	}
+	return int64(len(data)), nil
+}
+
+// Connect implements tcpip.Endpoint.Connect. It starts the association
+// handshake and returns tcpip.ErrConnectStarted; the endpoint becomes
+// writable once the association is established.
+func (e *endpoint) Connect(addr tcpip.FullAddress) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+
+	switch {
+	case e.state.connected():
+		if !e.connectNotified {
+			e.connectNotified = true
+			return nil
+		}
+		return &tcpip.ErrAlreadyConnected{}
+	case e.state.connecting():
+		return &tcpip.ErrAlreadyConnecting{}
+	case e.state == StateClosed:
+		if err := e.hardError; err != nil {
+			e.hardError = nil
+			return err
+		}
+		return &tcpip.ErrConnectionAborted{}
+	case e.state == StateListen:
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+
+	addr, netProto, err := e.AddrNetProtoLocked(addr, e.ops.GetV6Only())
+	if err != nil {
+		return err
+	}
+	if addr.Port == 0 {
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+
+	nicID := addr.NIC
+	if e.BindNICID != 0 {
+		if nicID != 0 && nicID != e.BindNICID {
+			return &tcpip.ErrHostUnreachable{}
+		}
+		nicID = e.BindNICID
+	}
+	if nicID == 0 {
+		nicID = tcpip.NICID(e.ops.GetBindToDevice())
+	}
+	r, err := e.stack.FindRoute(nicID, e.ID.LocalAddress, addr.Addr, netProto, false /* multicastLoop */)
+	if err != nil {
+		return err
+	}
+
+	netProtos := []tcpip.NetworkProtocolNumber{netProto}
+	id := stack.TransportEndpointID{
+		LocalAddress:  r.LocalAddress(),
+		LocalPort:     e.ID.LocalPort,
+		RemoteAddress: r.RemoteAddress(),
+		RemotePort:    addr.Port,
+	}
+	if !e.isPortReserved {
+		e.bindToDevice = tcpip.NICID(e.ops.GetBindToDevice())
+		res := ports.Reservation{
+			Networks:     netProtos,
+			Transport:    ProtocolNumber,
+			Addr:         id.LocalAddress,
+			Flags:        e.portFlags,
+			BindToDevice: e.bindToDevice,
+			Dest:         addr,
+		}
+		port, err := e.stack.ReservePort(e.stack.Rand(), res, nil /* testPort */)
+		if err != nil {
+			r.Release()
+			return err
+		}
+		res.Port = port
+		e.portRes = res
+		e.isPortReserved = true
+		id.LocalPort = port
+	}
+	if err := e.stack.RegisterTransportEndpoint(netProtos, ProtocolNumber, id, e, e.portFlags, e.bindToDevice); err != nil {
+		r.Release()
+		return err
+	}
+	e.isRegistered = true
+	e.effectiveNetProtos = netProtos
+	e.ID = id
+	e.RegisterNICID = r.NICID()
+	e.route = r
+
+	e.assoc.init(e)
+	e.sendInitLocked()
+	return &tcpip.ErrConnectStarted{}
+}
+
+// ConnectEndpoint is not supported.
+func (*endpoint) ConnectEndpoint(tcpip.Endpoint) tcpip.Error {
+	return &tcpip.ErrInvalidEndpointState{}
+}
+
+// Disconnect implements tcpip.Endpoint.Disconnect.
+func (*endpoint) Disconnect() tcpip.Error {
+	return &tcpip.ErrNotSupported{}
+}
+
+// Shutdown implements tcpip.Endpoint.Shutdown.
+func (e *endpoint) Shutdown(flags tcpip.ShutdownFlags) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+
+	switch {
+	case e.state == StateListen:
+		return nil
+	case e.state == StateEstablished:
+	case e.state.connected():
+		// The association is already being shut down.
+		if flags&tcpip.ShutdownRead != 0 {
+			e.assoc.rcvClosed = true
+			e.notifyLocked(waiter.ReadableEvents)
+		}
+		return nil
+	default:
+		return &tcpip.ErrNotConnected{}
+	}
+
+	if flags&tcpip.ShutdownRead != 0 {
+		e.assoc.rcvClosed = true
+		e.notifyLocked(waiter.ReadableEvents)
+	}
+	if flags&tcpip.ShutdownWrite != 0 {
+		e.startShutdownLocked()
+	}
+	return nil
+}
+
+// Listen implements tcpip.Endpoint.Listen.
+func (e *endpoint) Listen(backlog int) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+
+	switch e.state {
+	case StateListen:
+		e.backlog = backlog
+		return nil
+	case StateInitial:
+		if err := e.bindLocked(tcpip.FullAddress{}); err != nil {
+			return err
+		}
+	case StateBound:
+	default:
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+
+	if err := e.stack.RegisterTransportEndpoint(e.effectiveNetProtos, ProtocolNumber, e.ID, e, e.portFlags, e.bindToDevice); err != nil {
+		return err
+	}
+	e.isRegistered = true
+
+	e.cookieSecret = make([]byte, cookieSecretSize)
+	if _, err := io.ReadFull(e.stack.SecureRNG(), e.cookieSecret); err != nil {
+		panic(fmt.Sprintf("failed to generate SCTP cookie secret: %v", err))
+	}
+	e.backlog = backlog
+	e.state = StateListen
+	return nil
+}
+
+// Accept implements tcpip.Endpoint.Accept.
+func (e *endpoint) Accept(peerAddr *tcpip.FullAddress) (tcpip.Endpoint, *waiter.Queue, tcpip.Error) {
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+
+	if e.state != StateListen {
+		return nil, nil, &tcpip.ErrInvalidEndpointState{}
+	}
+	if len(e.acceptQueue) == 0 {
+		return nil, nil, &tcpip.ErrWouldBlock{}
+	}
+	n := e.acceptQueue[0]
+	e.acceptQueue[0] = nil
+	e.acceptQueue = e.acceptQueue[1:]
+	if peerAddr != nil {
+		*peerAddr = tcpip.FullAddress{
+			Addr: n.ID.RemoteAddress,
+			Port: n.ID.RemotePort,
+		}
+	}
+	return n, n.waiterQueue, nil
+}
+
+// bindLocked reserves addr for the endpoint.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) bindLocked(addr tcpip.FullAddress) tcpip.Error {
+	if e.state != StateInitial {
+		return &tcpip.ErrAlreadyBound{}
+	}
+
+	addr, netProto, err := e.AddrNetProtoLocked(addr, e.ops.GetV6Only())
+	if err != nil {
+		return err
+	}
+
+	// Expand netProtos to include v4 and v6 if the caller is binding to a
+	// wildcard (empty) address, and this is an IPv6 endpoint with v6only
+	// set to false.
+	netProtos := []tcpip.NetworkProtocolNumber{netProto}
+	if netProto == header.IPv6ProtocolNumber && !e.ops.GetV6Only() && len(addr.Addr) == 0 && e.stack.CheckNetworkProtocol(header.IPv4ProtocolNumber) {
+		netProtos = []tcpip.NetworkProtocolNumber{
+			header.IPv6ProtocolNumber,
+			header.IPv4ProtocolNumber,
+		}
+	}
+
+	var nicID tcpip.NICID
+	if len(addr.Addr) != 0 {
+		nicID = e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
+		if nicID == 0 {
+			return &tcpip.ErrBadLocalAddress{}
+		}
+	}
+
+	bindToDevice := tcpip.NICID(e.ops.GetBindToDevice())
+	res := ports.Reservation{
+		Networks:     netProtos,
+		Transport:    ProtocolNumber,
+		Addr:         addr.Addr,
+		Port:         addr.Port,
+		Flags:        e.portFlags,
+		BindToDevice: bindToDevice,
+	}
+	port, err := e.stack.ReservePort(e.stack.Rand(), res, nil /* testPort */)
+	if err != nil {
+		return err
+	}
+	res.Port = port
+	e.portRes = res
+	e.isPortReserved = true
+	e.bindToDevice = bindToDevice
+	e.effectiveNetProtos = netProtos
+	e.BindNICID = addr.NIC
+	e.RegisterNICID = nicID
+	e.BindAddr = addr.Addr
+	e.ID = stack.TransportEndpointID{
+		LocalAddress: addr.Addr,
+		LocalPort:    port,
+	}
+	e.state = StateBound
+	return nil
+}
+
+// Bind implements tcpip.Endpoint.Bind. SCTP endpoints are single-homed, so
+// only one address may be bound.
+func (e *endpoint) Bind(addr tcpip.FullAddress) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+	return e.bindLocked(addr)
+}
+
+// GetLocalAddress implements tcpip.Endpoint.GetLocalAddress.
+func (e *endpoint) GetLocalAddress() (tcpip.FullAddress, tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return tcpip.FullAddress{
+		Addr: e.ID.LocalAddress,
+		Port: e.ID.LocalPort,
+		NIC:  e.RegisterNICID,
+	}, nil
+}
+
+// GetRemoteAddress implements tcpip.Endpoint.GetRemoteAddress.
+func (e *endpoint) GetRemoteAddress() (tcpip.FullAddress, tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.state.connected() {
+		return tcpip.FullAddress{}, &tcpip.ErrNotConnected{}
+	}
+	return tcpip.FullAddress{
+		Addr: e.ID.RemoteAddress,
+		Port: e.ID.RemotePort,
+		NIC:  e.RegisterNICID,
+	}, nil
+}
+
+// Readiness implements tcpip.Endpoint.Readiness.
+func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var result waiter.EventMask
+	switch {
+	case e.state == StateInitial, e.state == StateBound:
+		result |= waiter.EventHUp
+	case e.state == StateListen:
+		if len(e.acceptQueue) != 0 {
+			result |= waiter.ReadableEvents
+		}
+	case e.state == StateClosed:
+		result = mask
+	case e.state.connected():
+		a := &e.assoc
+		if len(a.rcvQueue) != 0 || a.rcvClosed || e.state == StateShutdownReceived || e.state == StateShutdownAckSent {
+			result |= waiter.ReadableEvents
+		}
+		if e.state != StateEstablished {
+			result |= waiter.WritableEvents
+		} else if a.sndBufUsed < int(e.ops.GetSendBufferSize()) {
+			result |= waiter.WritableEvents
+		}
+	}
+	if e.hardError != nil {
+		result |= waiter.EventErr
+	}
+	return result & mask
+}
+
+// SetSockOpt implements tcpip.Endpoint.SetSockOpt.
+func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch v := opt.(type) {
+	case *tcpip.SCTPInitMsgOption:
+		if v.NumOutStreams != 0 {
+			e.initMsg.NumOutStreams = v.NumOutStreams
+		}
+		if v.MaxInStreams != 0 {
+			e.initMsg.MaxInStreams = v.MaxInStreams
+		}
+		if v.MaxAttempts != 0 {
+			e.initMsg.MaxAttempts = v.MaxAttempts
+		}
+		if v.MaxInitTimeout != 0 {
+			e.initMsg.MaxInitTimeout = v.MaxInitTimeout
+		}
+		return nil
+	case *tcpip.SCTPEventsOption:
+		e.events = *v
+		return nil
+	default:
+		return &tcpip.ErrUnknownProtocolOption{}
+	}
+}
+
+// GetSockOpt implements tcpip.Endpoint.GetSockOpt.
+func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) tcpip.Error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch v := opt.(type) {
+	case *tcpip.SCTPStatusOption:
+		if !e.state.connecting() && !e.state.connected() {
+			return &tcpip.ErrNotConnected{}
+		}
+		a := &e.assoc
+		unacked, pending := a.chunkCounts()
+		*v = tcpip.SCTPStatusOption{
+			State:              tcpip.EndpointState(e.state),
+			Rwnd:               a.peerRwnd,
+			UnackedData:        uint16(unacked),
+			PendingData:        uint16(pending),
+			InStreams:          a.inStreams,
+			OutStreams:         a.outStreams,
+			FragmentationPoint: uint32(a.fragPoint()),
+			PrimaryAddress: tcpip.FullAddress{
+				Addr: e.ID.RemoteAddress,
+				Port: e.ID.RemotePort,
+				NIC:  e.RegisterNICID,
+			},
+			Cwnd: a.cwnd,
+			SRTT: a.srtt,
+			RTO:  a.rto,
+			MTU:  a.mtu,
+		}
+		return nil
+	case *tcpip.SCTPInitMsgOption:
+		*v = e.initMsg
+		return nil
+	case *tcpip.SCTPEventsOption:
+		*v = e.events
+		return nil
+	default:
+		return &tcpip.ErrUnknownProtocolOption{}
+	}
+}
+
+// SetSockOptInt implements tcpip.Endpoint.SetSockOptInt.
+func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch opt {
+	case tcpip.IPv4TTLOption, tcpip.IPv6HopLimitOption:
+		if v < 0 {
+			v = 0
+		}
+		e.ttl = uint8(v)
+	case tcpip.IPv4TOSOption, tcpip.IPv6TrafficClassOption:
+		e.tos = uint8(v)
+	default:
+		return &tcpip.ErrUnknownProtocolOption{}
+	}
+	return nil
+}
+
+// GetSockOptInt implements tcpip.Endpoint.GetSockOptInt.
+func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch opt {
+	case tcpip.ReceiveQueueSizeOption:
+		n := 0
+		for _, m := range e.assoc.rcvQueue {
+			n += len(m.data) - m.off
+		}
+		return n, nil
+	case tcpip.SendQueueSizeOption:
+		return e.assoc.sndBufUsed, nil
+	case tcpip.IPv4TTLOption, tcpip.IPv6HopLimitOption:
+		return int(e.ttl), nil
+	case tcpip.IPv4TOSOption, tcpip.IPv6TrafficClassOption:
+		return int(e.tos), nil
+	default:
+		return -1, &tcpip.ErrUnknownProtocolOption{}
+	}
+}
+
+// State implements tcpip.Endpoint.State.
+func (e *endpoint) State() uint32 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return uint32(e.state)
+}
+
+// ModerateRecvBuf implements tcpip.Endpoint.ModerateRecvBuf.
+func (*endpoint) ModerateRecvBuf(int) {}
+
+// Info implements tcpip.Endpoint.Info.
+func (e *endpoint) Info() tcpip.EndpointInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	info := e.TransportEndpointInfo
+	return &info
+}
+
+// Stats implements tcpip.Endpoint.Stats.
+func (e *endpoint) Stats() tcpip.EndpointStats {
+	return &e.stats
+}
+
+// SetOwner implements tcpip.Endpoint.SetOwner.
+func (*endpoint) SetOwner(tcpip.PacketOwner) {}
+
+// SocketOptions implements tcpip.Endpoint.SocketOptions.
+func (e *endpoint) SocketOptions() *tcpip.SocketOptions {
+	return &e.ops
+}
+
+// Wait implements stack.TransportEndpoint.Wait.
+func (*endpoint) Wait() {}
+
+// HandleError implements stack.TransportEndpoint.HandleError.
+func (e *endpoint) HandleError(transErr stack.TransportError, pkt stack.PacketBufferPtr) {
+	if transErr.Kind() != stack.PacketTooBigTransportError {
+		return
+	}
+	e.mu.Lock()
+	defer e.unlockAndFlush()
+	if e.state.connected() || e.state.connecting() {
+		e.assoc.updateMTU(transErr.Info())
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"fmt"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/ports"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// afterLoad is invoked by stateify.
+func (e *endpoint) afterLoad() {
+	stack.StackFromEnv.RegisterRestoredEndpoint(e)
+}
+
+// Resume implements tcpip.ResumableEndpoint.Resume. Associations do not
+// survive save and restore: they are reported as aborted.
+func (e *endpoint) Resume(s *stack.Stack) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.stack = s
+	e.ops.InitHandler(e, e.stack, tcpip.GetStackSendBufferLimits, tcpip.GetStackReceiveBufferLimits)
+
+	switch {
+	case e.state == StateInitial, e.state == StateClosed:
+	case e.state == StateBound, e.state == StateListen:
+		res := ports.Reservation{
+			Networks:     e.effectiveNetProtos,
+			Transport:    ProtocolNumber,
+			Addr:         e.ID.LocalAddress,
+			Port:         e.ID.LocalPort,
+			Flags:        e.portFlags,
+			BindToDevice: e.bindToDevice,
+		}
+		if _, err := e.stack.ReservePort(e.stack.Rand(), res, nil /* testPort */); err != nil {
+			panic(fmt.Sprintf("unable to re-reserve port %d: %s", res.Port, err))
+		}
+		e.portRes = res
+		e.isPortReserved = true
+		if e.state == StateListen {
+			if err := e.stack.RegisterTransportEndpoint(e.effectiveNetProtos, ProtocolNumber, e.ID, e, e.portFlags, e.bindToDevice); err != nil {
+				panic(fmt.Sprintf("unable to re-register listening endpoint: %s", err))
+			}
+			e.isRegistered = true
+			e.cookieSecret = make([]byte, cookieSecretSize)
+			if _, err := io.ReadFull(e.stack.SecureRNG(), e.cookieSecret); err != nil {
+				panic(fmt.Sprintf("failed to generate SCTP cookie secret: %v", err))
+			}
+		}
+	case e.state.connecting(), e.state.connected():
+		e.hardError = &tcpip.ErrConnectionAborted{}
+		e.state = StateClosed
+	default:
+		panic(fmt.Sprintf("unhandled state = %s", e.state))
+	}
+}
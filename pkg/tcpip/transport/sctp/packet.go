@@ -0,0 +1,84 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// packet is a received SCTP packet.
+type packet struct {
+	hdr    header.SCTP
+	chunks []byte
+}
+
+// parsePacket returns the SCTP packet held in pkt. ok is false if the packet
+// is truncated or fails checksum validation.
+func parsePacket(pkt stack.PacketBufferPtr) (p packet, ok bool) {
+	hdr := header.SCTP(pkt.TransportHeader().Slice())
+	if len(hdr) < header.SCTPMinimumSize {
+		return packet{}, false
+	}
+	chunks := pkt.Data().AsRange().ToSlice()
+	if !pkt.RXTransportChecksumValidated && header.SCTPChecksum(hdr, chunks) != hdr.Checksum() {
+		return packet{}, false
+	}
+	return packet{hdr: hdr, chunks: chunks}, true
+}
+
+// outPacket is an SCTP packet that has been built while holding an
+// endpoint's lock and is written once the lock is released, since writing
+// may synchronously deliver packets to other endpoints on the same stack.
+type outPacket struct {
+	// route holds a reference that is released once the packet is sent.
+	route   *stack.Route
+	srcPort uint16
+	dstPort uint16
+	vtag    uint32
+	chunks  []byte
+	ttl     uint8
+	tos     uint8
+}
+
+func (p *outPacket) send() tcpip.Error {
+	defer p.route.Release()
+	return writePacket(p.route, p.srcPort, p.dstPort, p.vtag, p.chunks, p.ttl, p.tos)
+}
+
+// writePacket writes an SCTP packet carrying chunks to r. A zero ttl selects
+// the route's default.
+func writePacket(r *stack.Route, srcPort, dstPort uint16, vtag uint32, chunks []byte, ttl, tos uint8) tcpip.Error {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.SCTPMinimumSize + int(r.MaxHeaderLength()),
+		Payload:            bufferv2.MakeWithData(chunks),
+	})
+	defer pkt.DecRef()
+
+	hdr := header.SCTP(pkt.TransportHeader().Push(header.SCTPMinimumSize))
+	pkt.TransportProtocolNumber = ProtocolNumber
+	hdr.SetSourcePort(srcPort)
+	hdr.SetDestinationPort(dstPort)
+	hdr.SetVerificationTag(vtag)
+	hdr.SetChecksum(0)
+	hdr.SetChecksum(header.SCTPChecksum(hdr, chunks))
+
+	if ttl == 0 {
+		ttl = r.DefaultTTL()
+	}
+	return r.WritePacket(stack.NetworkHeaderParams{Protocol: ProtocolNumber, TTL: ttl, TOS: tos}, pkt)
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sctp contains the implementation of the SCTP transport protocol.
+//
+// Only the one-to-one socket style (SOCK_STREAM) is supported: each endpoint
+// carries at most one single-homed association. Multihoming, partial
+// reliability and the other SCTP extensions are not implemented, and peers
+// are told so by omitting them from INIT and INIT ACK chunks.
+package sctp
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/raw"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// ProtocolNumber is the sctp protocol number.
+	ProtocolNumber = header.SCTPProtocolNumber
+
+	// MinBufferSize is the smallest size of a receive or send buffer.
+	MinBufferSize = 4 << 10 // 4KiB bytes.
+
+	// DefaultSendBufferSize is the default size of the send buffer for
+	// an endpoint.
+	DefaultSendBufferSize = 208 << 10 // 208KiB
+
+	// DefaultReceiveBufferSize is the default size of the receive buffer
+	// for an endpoint.
+	DefaultReceiveBufferSize = 208 << 10 // 208KiB
+
+	// MaxBufferSize is the largest size a receive/send buffer can grow to.
+	MaxBufferSize = 4 << 20 // 4MiB
+)
+
+// The following protocol parameters match the Linux defaults in
+// net/sctp/protocol.c.
+const (
+	rtoInitial          = 3 * time.Second
+	rtoMin              = 1 * time.Second
+	rtoMax              = 60 * time.Second
+	maxInitRetransmits  = 8
+	maxAssocRetransmits = 10
+	validCookieLife     = 60 * time.Second
+	sackTimeout         = 200 * time.Millisecond
+	defaultOutStreams   = 10
+	defaultMaxInStreams = 0xffff
+)
+
+type protocol struct {
+	stack *stack.Stack
+}
+
+// Number returns the sctp protocol number.
+func (*protocol) Number() tcpip.TransportProtocolNumber {
+	return ProtocolNumber
+}
+
+// NewEndpoint creates a new sctp endpoint.
+func (p *protocol) NewEndpoint(netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
+	return newEndpoint(p.stack, netProto, waiterQueue), nil
+}
+
+// NewRawEndpoint creates a new raw SCTP endpoint. It implements
+// stack.TransportProtocol.NewRawEndpoint.
+func (p *protocol) NewRawEndpoint(netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
+	return raw.NewEndpoint(p.stack, netProto, ProtocolNumber, waiterQueue)
+}
+
+// MinimumPacketSize returns the minimum valid sctp packet size.
+func (*protocol) MinimumPacketSize() int {
+	return header.SCTPMinimumSize
+}
+
+// ParsePorts returns the source and destination ports stored in the given
+// sctp packet.
+func (*protocol) ParsePorts(v []byte) (src, dst uint16, err tcpip.Error) {
+	h := header.SCTP(v)
+	return h.SourcePort(), h.DestinationPort(), nil
+}
+
+// HandleUnknownDestinationPacket handles packets that are targeted at this
+// protocol but don't match any existing endpoint. Such packets are "out of
+// the blue" and are answered as described in RFC 9260 section 8.4.
+func (p *protocol) HandleUnknownDestinationPacket(id stack.TransportEndpointID, pkt stack.PacketBufferPtr) stack.UnknownDestinationPacketDisposition {
+	sp, ok := parsePacket(pkt)
+	if !ok {
+		return stack.UnknownDestinationPacketMalformed
+	}
+
+	vtag, reply, malformed := outOfTheBlueReply(sp)
+	if malformed {
+		return stack.UnknownDestinationPacketMalformed
+	}
+	if reply == nil {
+		return stack.UnknownDestinationPacketHandled
+	}
+
+	r, err := p.stack.FindRoute(pkt.NICID, id.LocalAddress, id.RemoteAddress, pkt.NetworkProtocolNumber, false /* multicastLoop */)
+	if err != nil {
+		return stack.UnknownDestinationPacketHandled
+	}
+	defer r.Release()
+	_ = writePacket(r, id.LocalPort, id.RemotePort, vtag, reply, 0 /* ttl */, 0 /* tos */)
+	return stack.UnknownDestinationPacketHandled
+}
+
+// SetOption implements stack.TransportProtocol.SetOption.
+func (*protocol) SetOption(tcpip.SettableTransportProtocolOption) tcpip.Error {
+	return &tcpip.ErrUnknownProtocolOption{}
+}
+
+// Option implements stack.TransportProtocol.Option.
+func (*protocol) Option(tcpip.GettableTransportProtocolOption) tcpip.Error {
+	return &tcpip.ErrUnknownProtocolOption{}
+}
+
+// Close implements stack.TransportProtocol.Close.
+func (*protocol) Close() {}
+
+// Wait implements stack.TransportProtocol.Wait.
+func (*protocol) Wait() {}
+
+// Pause implements stack.TransportProtocol.Pause.
+func (*protocol) Pause() {}
+
+// Resume implements stack.TransportProtocol.Resume.
+func (*protocol) Resume() {}
+
+// Parse implements stack.TransportProtocol.Parse.
+func (*protocol) Parse(pkt stack.PacketBufferPtr) bool {
+	_, ok := pkt.TransportHeader().Consume(header.SCTPMinimumSize)
+	pkt.TransportProtocolNumber = ProtocolNumber
+	return ok
+}
+
+// NewProtocol returns an SCTP transport protocol.
+func NewProtocol(s *stack.Stack) stack.TransportProtocol {
+	return &protocol{stack: s}
+}
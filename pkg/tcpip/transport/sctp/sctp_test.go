@@ -0,0 +1,237 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/refsvfs2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/testutil"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/sctp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const nicID = 1
+
+var localAddr = testutil.MustParse4("127.0.0.1")
+
+func newStack(t *testing.T) *stack.Stack {
+	t.Helper()
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{sctp.NewProtocol},
+	})
+	t.Cleanup(func() {
+		s.Close()
+		s.Wait()
+	})
+	if err := s.CreateNIC(nicID, loopback.New()); err != nil {
+		t.Fatalf("s.CreateNIC(%d, loopback.New()): %s", nicID, err)
+	}
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol: ipv4.ProtocolNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   localAddr,
+			PrefixLen: 8,
+		},
+	}
+	if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("s.AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+	return s
+}
+
+func newEndpoint(t *testing.T, s *stack.Stack) tcpip.Endpoint {
+	t.Helper()
+	ep, err := s.NewEndpoint(sctp.ProtocolNumber, ipv4.ProtocolNumber, &waiter.Queue{})
+	if err != nil {
+		t.Fatalf("s.NewEndpoint(%d, %d, _): %s", sctp.ProtocolNumber, ipv4.ProtocolNumber, err)
+	}
+	t.Cleanup(ep.Close)
+	return ep
+}
+
+// connect returns the client and server endpoints of a new association. The
+// listening endpoint is passed to setup, if not nil, before it listens.
+func connect(t *testing.T, s *stack.Stack, setup func(tcpip.Endpoint)) (tcpip.Endpoint, tcpip.Endpoint) {
+	t.Helper()
+	listener := newEndpoint(t, s)
+	if setup != nil {
+		setup(listener)
+	}
+	if err := listener.Bind(tcpip.FullAddress{Addr: localAddr}); err != nil {
+		t.Fatalf("listener.Bind(_): %s", err)
+	}
+	if err := listener.Listen(10); err != nil {
+		t.Fatalf("listener.Listen(10): %s", err)
+	}
+	addr, err := listener.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("listener.GetLocalAddress(): %s", err)
+	}
+
+	client := newEndpoint(t, s)
+	if err := client.Connect(addr); err != (&tcpip.ErrConnectStarted{}) {
+		t.Fatalf("client.Connect(%+v) = %v, want %s", addr, err, &tcpip.ErrConnectStarted{})
+	}
+	// Loopback delivers packets synchronously, so the handshake has
+	// completed.
+	if err := client.Connect(addr); err != nil {
+		t.Fatalf("client.Connect(%+v) after handshake: %s", addr, err)
+	}
+	server, _, err := listener.Accept(nil)
+	if err != nil {
+		t.Fatalf("listener.Accept(nil): %s", err)
+	}
+	t.Cleanup(server.Close)
+	return client, server
+}
+
+func write(t *testing.T, ep tcpip.Endpoint, data []byte, info tcpip.SCTPSndRcvInfo) {
+	t.Helper()
+	var opts tcpip.WriteOptions
+	opts.ControlMessages.HasSCTPSndRcvInfo = true
+	opts.ControlMessages.SCTPSndRcvInfo = info
+	n, err := ep.Write(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatalf("ep.Write(_, %+v): %s", opts, err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("ep.Write(_, %+v) = %d, want %d", opts, n, len(data))
+	}
+}
+
+func read(t *testing.T, ep tcpip.Endpoint) ([]byte, tcpip.ReadResult) {
+	t.Helper()
+	var buf bytes.Buffer
+	res, err := ep.Read(&buf, tcpip.ReadOptions{})
+	if err != nil {
+		t.Fatalf("ep.Read(_, {}): %s", err)
+	}
+	return buf.Bytes(), res
+}
+
+func TestMessagesPreserveBoundaries(t *testing.T) {
+	s := newStack(t)
+	client, server := connect(t, s, func(listener tcpip.Endpoint) {
+		events := tcpip.SCTPEventDataIO
+		if err := listener.SetSockOpt(&events); err != nil {
+			t.Fatalf("listener.SetSockOpt(&%d): %s", events, err)
+		}
+	})
+
+	messages := []struct {
+		data []byte
+		info tcpip.SCTPSndRcvInfo
+	}{
+		{data: []byte("first"), info: tcpip.SCTPSndRcvInfo{Stream: 1, PPID: 51}},
+		{data: []byte("second message"), info: tcpip.SCTPSndRcvInfo{Stream: 2, PPID: 53, Unordered: true}},
+	}
+	for _, m := range messages {
+		write(t, client, m.data, m.info)
+	}
+	for _, m := range messages {
+		got, res := read(t, server)
+		if !bytes.Equal(got, m.data) {
+			t.Errorf("got data = %q, want = %q", got, m.data)
+		}
+		if !res.EndOfRecord {
+			t.Errorf("got res.EndOfRecord = false, want = true")
+		}
+		info := res.ControlMessages.SCTPSndRcvInfo
+		if !res.ControlMessages.HasSCTPSndRcvInfo || info.Stream != m.info.Stream || info.PPID != m.info.PPID || info.Unordered != m.info.Unordered {
+			t.Errorf("got control messages = %+v, want SCTPSndRcvInfo with %+v", res.ControlMessages, m.info)
+		}
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	s := newStack(t)
+	client, server := connect(t, s, nil)
+
+	var status tcpip.SCTPStatusOption
+	if err := client.GetSockOpt(&status); err != nil {
+		t.Fatalf("client.GetSockOpt(&status): %s", err)
+	}
+	if status.State != tcpip.EndpointState(sctp.StateEstablished) {
+		t.Errorf("got status.State = %d, want = %d", status.State, sctp.StateEstablished)
+	}
+
+	// A message that spans several DATA chunks is delivered whole.
+	data := make([]byte, 3*status.FragmentationPoint+1)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	write(t, client, data, tcpip.SCTPSndRcvInfo{})
+	got, res := read(t, server)
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes of data, want %d bytes matching the message", len(got), len(data))
+	}
+	if !res.EndOfRecord {
+		t.Errorf("got res.EndOfRecord = false, want = true")
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	s := newStack(t)
+	client, server := connect(t, s, nil)
+
+	write(t, client, []byte("bye"), tcpip.SCTPSndRcvInfo{})
+	client.Close()
+
+	if got, _ := read(t, server); string(got) != "bye" {
+		t.Errorf("got data = %q, want = %q", got, "bye")
+	}
+	var buf bytes.Buffer
+	if _, err := server.Read(&buf, tcpip.ReadOptions{}); err != (&tcpip.ErrClosedForReceive{}) {
+		t.Errorf("server.Read(_, {}) = %v, want %s", err, &tcpip.ErrClosedForReceive{})
+	}
+	if got, want := sctp.EndpointState(server.State()), sctp.StateClosed; got != want {
+		t.Errorf("got server.State() = %s, want = %s", got, want)
+	}
+	if got, want := sctp.EndpointState(client.State()), sctp.StateClosed; got != want {
+		t.Errorf("got client.State() = %s, want = %s", got, want)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	s := newStack(t)
+	ep := newEndpoint(t, s)
+
+	addr := tcpip.FullAddress{Addr: localAddr, Port: 9}
+	if err := ep.Connect(addr); err != (&tcpip.ErrConnectStarted{}) {
+		t.Fatalf("ep.Connect(%+v) = %v, want %s", addr, err, &tcpip.ErrConnectStarted{})
+	}
+	// The INIT chunk is answered with an ABORT chunk.
+	if err := ep.Connect(addr); err != (&tcpip.ErrConnectionRefused{}) {
+		t.Errorf("ep.Connect(%+v) = %v, want %s", addr, err, &tcpip.ErrConnectionRefused{})
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refsvfs2.DoLeakCheck()
+	os.Exit(code)
+}
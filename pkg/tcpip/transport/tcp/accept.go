@@ -190,7 +190,14 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 		netProto = s.pkt.NetworkProtocolNumber
 	}
 
-	route, err := l.stack.FindRoute(s.pkt.NICID, s.pkt.Network().DestinationAddress(), s.pkt.Network().SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
+	// Connections accepted by transparent listeners may be to non-local
+	// addresses, e.g. if they were diverted by the TPROXY target.
+	transparent := l.listenEP != nil && l.listenEP.ops.GetTransparent()
+	findRoute := l.stack.FindRoute
+	if transparent {
+		findRoute = l.stack.FindTransparentRoute
+	}
+	route, err := findRoute(s.pkt.NICID, s.pkt.Network().DestinationAddress(), s.pkt.Network().SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
 	if err != nil {
 		return nil, err // +checklocksignore
 	}
@@ -198,6 +205,7 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 	n = newEndpoint(l.stack, l.protocol, netProto, queue)
 	n.mu.Lock()
 	n.ops.SetV6Only(l.v6Only)
+	n.ops.SetTransparent(transparent)
 	n.TransportEndpointInfo.ID = s.id
 	n.boundNICID = s.pkt.NICID
 	n.route = route
@@ -233,7 +241,7 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 // modified.
 //
 // Precondition: if l.listenEP != nil, l.listenEP.mu must be locked.
-func (l *listenContext) startHandshake(s *segment, opts header.TCPSynOptions, queue *waiter.Queue, owner tcpip.PacketOwner) (h *handshake, _ tcpip.Error) {
+func (l *listenContext) startHandshake(s *segment, opts header.TCPSynOptions, queue *waiter.Queue, owner tcpip.PacketOwner, fastOpen passiveFastOpen) (h *handshake, _ tcpip.Error) {
 	// Create new endpoint.
 	irs := s.sequenceNumber
 	isn := generateSecureISN(s.id, l.stack.Clock(), l.protocol.seqnumSecret)
@@ -293,6 +301,11 @@ func (l *listenContext) startHandshake(s *segment, opts header.TCPSynOptions, qu
 	// Initialize and start the handshake.
 	h = ep.newPassiveHandshake(isn, irs, opts, deferAccept)
 	h.listenEP = l.listenEP
+	h.sendFastOpen = fastOpen.cookie != nil
+	h.fastOpenCookie = fastOpen.cookie
+	if fastOpen.acceptData {
+		h.acceptFastOpenDataLocked(s)
+	}
 	h.start()
 	h.ep.mu.Unlock()
 	return h, nil
@@ -307,7 +320,7 @@ func (l *listenContext) performHandshake(s *segment, opts header.TCPSynOptions,
 	queue.EventRegister(&waitEntry)
 	defer queue.EventUnregister(&waitEntry)
 
-	h, err := l.startHandshake(s, opts, queue, owner)
+	h, err := l.startHandshake(s, opts, queue, owner, passiveFastOpen{})
 	if err != nil {
 		return nil, err
 	}
@@ -359,10 +372,16 @@ func (l *listenContext) performHandshake(s *segment, opts header.TCPSynOptions,
 // +checklocks:n.mu
 func (e *endpoint) propagateInheritableOptionsLocked(n *endpoint) {
 	n.userTimeout = e.userTimeout
+	n.maxRetries = e.maxRetries
 	n.portFlags = e.portFlags
 	n.boundBindToDevice = e.boundBindToDevice
 	n.boundPortFlags = e.boundPortFlags
 	n.userMSS = e.userMSS
+	e.copyMD5KeysTo(n)
+	if n.md5KeyFor(n.TransportEndpointInfo.ID.RemoteAddress) != nil {
+		// Each segment must be signed individually.
+		n.gso = stack.GSO{}
+	}
 }
 
 // reserveTupleLocked reserves an accepted endpoint's tuple.
@@ -422,6 +441,11 @@ type acceptQueue struct {
 	// in progress.
 	pendingEndpoints map[*endpoint]struct{}
 
+	// fastOpenEndpoints is a set of all endpoints that were delivered to
+	// endpoints by TCP Fast Open and for which a handshake is still in
+	// progress.
+	fastOpenEndpoints map[*endpoint]struct{}
+
 	// capacity is the maximum number of endpoints that can be in endpoints.
 	capacity int
 }
@@ -462,6 +486,7 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 
 		opts := parseSynSegmentOptions(s)
 
+		delivered := false
 		useSynCookies, err := func() (bool, tcpip.Error) {
 			var alwaysUseSynCookies tcpip.TCPAlwaysUseSynCookies
 			if err := e.stack.TransportProtocolOption(header.TCPProtocolNumber, &alwaysUseSynCookies); err != nil {
@@ -481,25 +506,42 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 				return true, nil
 			}
 
-			h, err := ctx.startHandshake(s, opts, &waiter.Queue{}, e.owner)
+			fastOpen := e.fastOpenSYNLocked(s, &opts)
+			h, err := ctx.startHandshake(s, opts, &waiter.Queue{}, e.owner, fastOpen)
 			if err != nil {
 				e.stack.Stats().TCP.FailedConnectionAttempts.Increment()
 				e.stats.FailedConnectionAttempts.Increment()
 				return false, err
 			}
-			e.acceptQueue.pendingEndpoints[h.ep] = struct{}{}
+			if fastOpen.acceptData {
+				// The endpoint can be accepted, and its data read,
+				// before the handshake completes. See RFC 7413,
+				// section 4.2.2.
+				e.acceptQueue.fastOpenEndpoints[h.ep] = struct{}{}
+				e.acceptQueue.endpoints.PushBack(h.ep)
+				delivered = true
+			} else {
+				e.acceptQueue.pendingEndpoints[h.ep] = struct{}{}
+			}
 
 			return false, nil
 		}()
 		if err != nil {
 			return err
 		}
+		if delivered {
+			e.waiterQueue.Notify(waiter.ReadableEvents)
+		}
 		if !useSynCookies {
 			return nil
 		}
 
 		net := s.pkt.Network()
-		route, err := e.stack.FindRoute(s.pkt.NICID, net.DestinationAddress(), net.SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
+		findRoute := e.stack.FindRoute
+		if e.ops.GetTransparent() {
+			findRoute = e.stack.FindTransparentRoute
+		}
+		route, err := findRoute(s.pkt.NICID, net.DestinationAddress(), net.SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
 		if err != nil {
 			return err
 		}
@@ -20,6 +20,7 @@ import (
 	"math"
 	"time"
 
+	"gvisor.dev/gvisor/pkg/bufferv2"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/checksum"
@@ -113,6 +114,25 @@ type handshake struct {
 	// retransmitTimer is used to retransmit SYN/SYN-ACK with exponential backoff
 	// till handshake is either completed or timesout.
 	retransmitTimer *backoffTimer `state:"nosave"`
+
+	// sendFastOpen is true if the first SYN/SYN-ACK carries a TCP Fast Open
+	// option with fastOpenCookie, which is empty in a cookie request.
+	sendFastOpen   bool
+	fastOpenCookie []byte
+
+	// fastOpenAccepted is true for a passive open whose SYN carried a valid
+	// TCP Fast Open cookie. The endpoint was delivered to the accept queue
+	// of listenEP before the handshake completed.
+	fastOpenAccepted bool
+
+	// synData is the data sent in the SYN of an active open with TCP Fast
+	// Open, until it is acknowledged or the handshake completes.
+	synData bufferv2.Buffer
+
+	// deferred is true if the handshake of an active open waits for the
+	// first write, whose data is sent in the SYN. See
+	// tcpip.TCPFastOpenConnectOption.
+	deferred bool
 }
 
 // maybeFailTimerHandler takes a handler function for a timer that may fail and
@@ -284,7 +304,7 @@ func (h *handshake) resetToSynRcvd(iss seqnum.Value, irs seqnum.Value, opts head
 // a TCP 3-way handshake is valid. If it's not, a RST segment is sent back in
 // response.
 func (h *handshake) checkAck(s *segment) bool {
-	if s.flags.Contains(header.TCPFlagAck) && s.ackNumber != h.iss+1 {
+	if s.flags.Contains(header.TCPFlagAck) && !h.acceptableAck(s.ackNumber) {
 		// RFC 793, page 72 (https://datatracker.ietf.org/doc/html/rfc793#page-72):
 		//   If the segment acknowledgment is not acceptable, form a reset segment,
 		//        <SEQ=SEG.ACK><CTL=RST>
@@ -296,6 +316,12 @@ func (h *handshake) checkAck(s *segment) bool {
 	return true
 }
 
+// acceptableAck returns true if ack acknowledges our SYN, and possibly some
+// or all of the data sent with it.
+func (h *handshake) acceptableAck(ack seqnum.Value) bool {
+	return ack.InRange(h.iss+1, h.iss.Add(seqnum.Size(h.synData.Size())+2))
+}
+
 // synSentState handles a segment received when the TCP 3-way handshake is in
 // the SYN-SENT state.
 // +checklocks:h.ep.mu
@@ -303,7 +329,7 @@ func (h *handshake) synSentState(s *segment) tcpip.Error {
 	// RFC 793, page 37, states that in the SYN-SENT state, a reset is
 	// acceptable if the ack field acknowledges the SYN.
 	if s.flags.Contains(header.TCPFlagRst) {
-		if s.flags.Contains(header.TCPFlagAck) && s.ackNumber == h.iss+1 {
+		if s.flags.Contains(header.TCPFlagAck) && h.acceptableAck(s.ackNumber) {
 			// RFC 793, page 67, states that "If the RST bit is set [and] If the ACK
 			// was acceptable then signal the user "error: connection reset", drop
 			// the segment, enter CLOSED state, delete TCB, and return."
@@ -342,10 +368,12 @@ func (h *handshake) synSentState(s *segment) tcpip.Error {
 	// If this is a SYN ACK response, we only need to acknowledge the SYN
 	// and the handshake is completed.
 	if s.flags.Contains(header.TCPFlagAck) {
+		h.fastOpenSYNACKLocked(s, rcvSynOpts)
 		h.state = handshakeCompleted
 		h.transitionToStateEstablishedLocked(s)
 
 		h.ep.sendEmptyRaw(header.TCPFlagAck, h.iss+1, h.ackNum, h.rcvWnd>>h.effectiveRcvWndScale())
+		h.retransmitSYNDataLocked()
 		return nil
 	}
 
@@ -470,7 +498,7 @@ func (h *handshake) synRcvdState(s *segment) tcpip.Error {
 		// https://github.com/torvalds/linux/blob/7acac4b3196/net/ipv4/tcp_ipv4.c#L1523
 		// We could abort the connection as well with a tunable as in
 		// https://github.com/torvalds/linux/blob/7acac4b3196/net/ipv4/tcp_minisocks.c#L788
-		if listenEP := h.listenEP; listenEP != nil && listenEP.acceptQueueIsFull() {
+		if listenEP := h.listenEP; listenEP != nil && !h.fastOpenAccepted && listenEP.acceptQueueIsFull() {
 			listenEP.stack.Stats().DroppedPackets.Increment()
 			return nil
 		}
@@ -482,6 +510,7 @@ func (h *handshake) synRcvdState(s *segment) tcpip.Error {
 
 		h.state = handshakeCompleted
 		h.transitionToStateEstablishedLocked(s)
+		h.retransmitSYNDataLocked()
 
 		// Requeue the segment if the ACK completing the handshake has more info
 		// to be processed by the newly established endpoint.
@@ -570,9 +599,12 @@ func (h *handshake) start() {
 			synOpts.WS = -1
 		}
 	}
+	synOpts.FastOpen = h.sendFastOpen
+	synOpts.FastOpenCookie = h.fastOpenCookie
 
+	// Only the first SYN carries data; it is retransmitted without.
 	h.sendSYNOpts = synOpts
-	h.ep.sendSynTCP(h.ep.route, tcpFields{
+	h.ep.sendSynDataTCP(h.ep.route, tcpFields{
 		id:     h.ep.TransportEndpointInfo.ID,
 		ttl:    calculateTTL(h.ep.route, h.ep.ipv4TTL, h.ep.ipv6HopLimit),
 		tos:    h.ep.sendTOS,
@@ -580,7 +612,7 @@ func (h *handshake) start() {
 		seq:    h.iss,
 		ack:    h.ackNum,
 		rcvWnd: h.rcvWnd,
-	}, synOpts)
+	}, synOpts, h.synData.Clone())
 }
 
 // retransmitHandler handles retransmissions of un-acked SYNs.
@@ -725,7 +757,7 @@ func putOptions(options []byte) {
 	optionPool.Put(optionsToArray(options))
 }
 
-func makeSynOptions(opts header.TCPSynOptions) []byte {
+func makeSynOptions(opts header.TCPSynOptions, md5 bool) []byte {
 	// Emulate linux option order. This is as follows:
 	//
 	// if md5: NOP NOP MD5SIG 18 md5sig(16)
@@ -743,9 +775,15 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 	//	cookie(variable) [padding to four bytes]
 	//
 	options := getOptions()
+	offset := 0
+
+	// The digest is computed once the rest of the segment is known.
+	if md5 {
+		offset += encodeMD5Placeholder(options[offset:])
+	}
 
 	// Always encode the mss.
-	offset := header.EncodeMSSOption(uint32(opts.MSS), options)
+	offset += header.EncodeMSSOption(uint32(opts.MSS), options[offset:])
 
 	// Special ordering is required here. If both TS and SACK are enabled,
 	// then the SACK option precedes TS, with no padding. If they are
@@ -769,12 +807,16 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 		offset += header.EncodeWSOption(opts.WS, options[offset:])
 	}
 
-	// Padding to the end; note that this never apply unless we add a
-	// fastopen option, we always expect the offset to remain the same.
-	if delta := header.AddTCPOptionPadding(options, offset); delta != 0 {
-		panic("unexpected option encoding")
+	// Initialize the Fast Open option, unless there is no room left for
+	// it.
+	if opts.FastOpen && (offset+header.TCPOptionFastOpenMinLength+len(opts.FastOpenCookie)+3)&^3 <= maxOptionSize {
+		offset += header.EncodeFastOpenOption(opts.FastOpenCookie, options[offset:])
 	}
 
+	// Padding to the end; this only applies to the fastopen option, as the
+	// offset is otherwise always a multiple of four.
+	offset += header.AddTCPOptionPadding(options, offset)
+
 	return options[:offset]
 }
 
@@ -790,12 +832,27 @@ type tcpFields struct {
 	rcvWnd seqnum.Size
 	opts   []byte
 	txHash uint32
+
+	// md5Key is the TCP MD5 signature key used to sign the segment, if any.
+	// If set, opts must start with the option encoded by
+	// encodeMD5Placeholder.
+	md5Key []byte
 }
 
 func (e *endpoint) sendSynTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOptions) tcpip.Error {
-	tf.opts = makeSynOptions(opts)
+	return e.sendSynDataTCP(r, tf, opts, bufferv2.Buffer{})
+}
+
+// sendSynDataTCP is like sendSynTCP, but the SYN carries data, as with TCP
+// Fast Open. This method takes ownership of data.
+func (e *endpoint) sendSynDataTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOptions, data bufferv2.Buffer) tcpip.Error {
+	tf.md5Key = e.md5KeyFor(tf.id.RemoteAddress)
+	tf.opts = makeSynOptions(opts, tf.md5Key != nil)
 	// We ignore SYN send errors and let the callers re-attempt send.
-	p := stack.NewPacketBuffer(stack.PacketBufferOptions{ReserveHeaderBytes: header.TCPMinimumSize + int(r.MaxHeaderLength()) + len(tf.opts)})
+	p := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.TCPMinimumSize + int(r.MaxHeaderLength()) + len(tf.opts),
+		Payload:            data,
+	})
 	defer p.DecRef()
 	if err := e.sendTCP(r, tf, p, stack.GSO{}); err != nil {
 		e.stats.SendErrors.SynSendToNetworkFailed.Increment()
@@ -807,11 +864,17 @@ func (e *endpoint) sendSynTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOp
 // This method takes ownership of pkt.
 func (e *endpoint) sendTCP(r *stack.Route, tf tcpFields, pkt stack.PacketBufferPtr, gso stack.GSO) tcpip.Error {
 	tf.txHash = e.txHash
+	// As in Linux, a GSO segment counts as the number of MSS-sized segments
+	// it would be split into.
+	segs := uint64(1)
+	if size := pkt.Data().Size(); gso.Type != stack.GSONone && int(gso.MSS) < size {
+		segs = uint64((size-1)/int(gso.MSS) + 1)
+	}
 	if err := sendTCP(r, tf, pkt, gso, e.owner); err != nil {
 		e.stats.SendErrors.SegmentSendToNetworkFailed.Increment()
 		return err
 	}
-	e.stats.SegmentsSent.Increment()
+	e.stats.SegmentsSent.IncrementBy(segs)
 	return nil
 }
 
@@ -829,6 +892,9 @@ func buildTCPHdr(r *stack.Route, tf tcpFields, pkt stack.PacketBufferPtr, gso st
 		WindowSize: uint16(tf.rcvWnd),
 	})
 	copy(tcp[header.TCPMinimumSize:], tf.opts)
+	if tf.md5Key != nil {
+		signTCPHdr(r, tf.md5Key, tcp, pkt.Data())
+	}
 
 	xsum := r.PseudoHeaderChecksum(ProtocolNumber, uint16(pkt.Size()))
 	// Only calculate the checksum if offloading isn't supported.
@@ -900,7 +966,7 @@ func sendTCP(r *stack.Route, tf tcpFields, pkt stack.PacketBufferPtr, gso stack.
 		tf.rcvWnd = math.MaxUint16
 	}
 
-	if r.Loop()&stack.PacketLoop == 0 && gso.Type == stack.GSOGvisor && int(gso.MSS) < pkt.Data().Size() {
+	if gso.Type == stack.GSOGvisor && int(gso.MSS) < pkt.Data().Size() && !r.HasLocalGSOCapability() {
 		return sendTCPBatch(r, tf, pkt, gso, owner)
 	}
 
@@ -920,14 +986,18 @@ func sendTCP(r *stack.Route, tf tcpFields, pkt stack.PacketBufferPtr, gso stack.
 	return nil
 }
 
-// makeOptions makes an options slice.
-func (e *endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
+// makeOptions makes an options slice. If md5 is true, it starts with a
+// placeholder for the TCP MD5 signature option.
+func (e *endpoint) makeOptions(sackBlocks []header.SACKBlock, md5 bool) []byte {
 	options := getOptions()
 	offset := 0
 
 	// N.B. the ordering here matches the ordering used by Linux internally
 	// and described in the raw makeOptions function. We don't include
 	// unnecessary cases here (post connection.)
+	if md5 {
+		offset += encodeMD5Placeholder(options[offset:])
+	}
 	if e.SendTSOk {
 		// Embed the timestamp if timestamp has been enabled.
 		//
@@ -945,7 +1015,9 @@ func (e *endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeTSOption(e.tsValNow(), e.recentTimestamp(), options[offset:])
 	}
-	if e.SACKPermitted && len(sackBlocks) > 0 {
+	// As in Linux, SACK blocks are only sent if there is room for at least
+	// one, which may not be the case with the MD5 signature option.
+	if e.SACKPermitted && len(sackBlocks) > 0 && maxOptionSize-offset >= 2+2+8 {
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeSACKBlocks(sackBlocks, options[offset:])
@@ -973,7 +1045,8 @@ func (e *endpoint) sendRaw(pkt stack.PacketBufferPtr, flags header.TCPFlags, seq
 	if e.EndpointState() == StateEstablished && e.rcv.pendingRcvdSegments.Len() > 0 && (flags&header.TCPFlagAck != 0) {
 		sackBlocks = e.sack.Blocks[:e.sack.NumBlocks]
 	}
-	options := e.makeOptions(sackBlocks)
+	md5Key := e.md5KeyFor(e.TransportEndpointInfo.ID.RemoteAddress)
+	options := e.makeOptions(sackBlocks, md5Key != nil)
 	defer putOptions(options)
 	pkt.ReserveHeaderBytes(header.TCPMinimumSize + int(e.route.MaxHeaderLength()) + len(options))
 	return e.sendTCP(e.route, tcpFields{
@@ -985,6 +1058,7 @@ func (e *endpoint) sendRaw(pkt stack.PacketBufferPtr, flags header.TCPFlags, seq
 		ack:    ack,
 		rcvWnd: rcvWnd,
 		opts:   options,
+		md5Key: md5Key,
 	}, pkt, e.gso)
 }
 
@@ -1294,15 +1368,17 @@ func (e *endpoint) keepaliveTimerExpired() tcpip.Error {
 		return nil
 	}
 
-	// If a userTimeout is set then abort the connection if it is
-	// exceeded.
-	if userTimeout != 0 && e.stack.Clock().NowMonotonic().Sub(e.rcv.lastRcvdAckTime) >= userTimeout && e.keepalive.unacked > 0 {
-		e.keepalive.Unlock()
-		e.stack.Stats().TCP.EstablishedTimedout.Increment()
-		return &tcpip.ErrTimeout{}
+	// If a userTimeout is set then it replaces the keepalive count as the
+	// bound on unanswered probes, and the connection is aborted once nothing
+	// has been heard from the peer for userTimeout. See RFC 5482 section 4.2
+	// and Linux's net/ipv4/tcp_timer.c:tcp_keepalive_timer().
+	var timedOut bool
+	if userTimeout != 0 {
+		timedOut = e.keepalive.unacked > 0 && e.stack.Clock().NowMonotonic().Sub(e.rcv.lastRcvdAckTime) >= userTimeout
+	} else {
+		timedOut = e.keepalive.unacked >= e.keepalive.count
 	}
-
-	if e.keepalive.unacked >= e.keepalive.count {
+	if timedOut {
 		e.keepalive.Unlock()
 		e.stack.Stats().TCP.EstablishedTimedout.Increment()
 		return &tcpip.ErrTimeout{}
@@ -1344,6 +1420,24 @@ func (e *endpoint) resetKeepaliveTimer(receivedData bool) {
 	}
 }
 
+// setKeepaliveIdle changes the keepalive idle time. As in Linux's
+// tcp_sock_set_keepidle_locked(), a running keepalive timer is restarted so
+// that the new idle time is measured from the last segment received, without
+// forgetting about probes that are already unanswered.
+func (e *endpoint) setKeepaliveIdle(idle time.Duration) {
+	e.keepalive.Lock()
+	defer e.keepalive.Unlock()
+	e.keepalive.idle = idle
+	if !e.keepalive.timer.enabled() || !e.EndpointState().connected() {
+		return
+	}
+	delay := idle - e.stack.Clock().NowMonotonic().Sub(e.rcv.lastRcvdAckTime)
+	if delay < 0 {
+		delay = 0
+	}
+	e.keepalive.timer.enable(delay)
+}
+
 // disableKeepaliveTimer stops the keepalive timer.
 func (e *endpoint) disableKeepaliveTimer() {
 	e.keepalive.Lock()
@@ -101,6 +101,14 @@ func deliverAccepted(ep *endpoint) bool {
 	lEP := ep.h.listenEP
 	lEP.acceptMu.Lock()
 
+	// An endpoint accepted by TCP Fast Open is already in the accept queue,
+	// or has even been accepted.
+	if ep.h.fastOpenAccepted {
+		delete(lEP.acceptQueue.fastOpenEndpoints, ep)
+		lEP.acceptMu.Unlock()
+		return true
+	}
+
 	// Remove endpoint from list of pendingEndpoints as the handshake is now
 	// complete.
 	delete(lEP.acceptQueue.pendingEndpoints, ep)
@@ -151,6 +159,7 @@ func (p *processor) handleConnecting(ep *endpoint) {
 		if lEP := ep.h.listenEP; lEP != nil {
 			lEP.acceptMu.Lock()
 			delete(lEP.acceptQueue.pendingEndpoints, ep)
+			delete(lEP.acceptQueue.fastOpenEndpoints, ep)
 			lEP.acceptMu.Unlock()
 		}
 		ep.handshakeFailed(err)
@@ -216,6 +225,7 @@ func (p *processor) startTimeWait(ep *endpoint) {
 	// Wake up any waiters before we start TIME-WAIT.
 	ep.waiterQueue.Notify(waiter.EventHUp | waiter.EventErr | waiter.ReadableEvents | waiter.WritableEvents)
 	timeWaitDuration := ep.getTimeWaitDuration()
+	ep.timeWaitDeadline = ep.stack.Clock().NowMonotonic().Add(timeWaitDuration)
 	ep.timeWaitTimer = ep.stack.Clock().AfterFunc(timeWaitDuration, ep.timeWaitTimerExpired)
 }
 
@@ -244,7 +254,9 @@ func (p *processor) handleTimeWait(ep *endpoint) {
 		return
 	}
 	if extendTimeWait {
-		ep.timeWaitTimer.Reset(ep.getTimeWaitDuration())
+		timeWaitDuration := ep.getTimeWaitDuration()
+		ep.timeWaitDeadline = ep.stack.Clock().NowMonotonic().Add(timeWaitDuration)
+		ep.timeWaitTimer.Reset(timeWaitDuration)
 	}
 	ep.mu.Unlock()
 }
@@ -434,6 +446,13 @@ func (d *dispatcher) queuePacket(stackEP stack.TransportEndpoint, id stack.Trans
 		return
 	}
 
+	// Per RFC 2385 section 2.0, segments with a missing or incorrect MD5
+	// signature are silently dropped.
+	if !ep.md5Valid(s) {
+		ep.stack.Stats().DroppedPackets.Increment()
+		return
+	}
+
 	ep.stack.Stats().TCP.ValidSegmentsReceived.Increment()
 	ep.stats.SegmentsReceived.Increment()
 	if (s.flags & header.TCPFlagRst) != 0 {
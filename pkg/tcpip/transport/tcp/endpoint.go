@@ -282,6 +282,12 @@ type sndQueueInfo struct {
 	// sndWaker is used to signal the protocol goroutine when there may be
 	// segments that need to be sent.
 	sndWaker sleep.Waker `state:"manual"`
+
+	// sndQueued and sndReleased are the total number of bytes that have been
+	// added to and released from the send queue respectively. They are used
+	// as offsets into the send queue to track MSG_ZEROCOPY sends.
+	sndQueued   uint64
+	sndReleased uint64
 }
 
 // CloneState clones sq into other. It is not thread safe
@@ -472,10 +478,30 @@ type endpoint struct {
 	// retransmissions.
 	maxSynRetries uint8
 
+	// maxRetries is the maximum number of times a segment is retransmitted,
+	// or of consecutive unanswered zero window probes, before the connection
+	// is aborted. It defaults to the stack's tcp_retries2, and is ignored
+	// for retransmissions if userTimeout is set.
+	maxRetries uint32
+
 	// windowClamp is used to bound the size of the advertised window to
 	// this value.
 	windowClamp uint32
 
+	// fastOpenQueueLen is the maximum number of endpoints that a listening
+	// endpoint delivers to its accept queue with TCP Fast Open before their
+	// handshake completes. Zero disables passive TCP Fast Open.
+	fastOpenQueueLen int
+
+	// fastOpenConnect is true if Connect defers the handshake until the
+	// first write, so that its data may be sent in the SYN.
+	fastOpenConnect bool
+
+	// fastOpenDeferred is non-zero while the handshake is deferred by
+	// fastOpenConnect. It is accessed atomically so that Readiness doesn't
+	// need to acquire mu.
+	fastOpenDeferred atomicbitops.Uint32
+
 	// sndQueueInfo contains the implementation of the endpoint's send queue.
 	sndQueueInfo sndQueueInfo
 
@@ -543,6 +569,15 @@ type endpoint struct {
 
 	gso stack.GSO
 
+	// md5Mu protects md5Keys. It is separate from mu so that incoming
+	// segments can be verified before they are queued to the endpoint.
+	md5Mu sync.Mutex `state:"nosave"`
+
+	// md5Keys are the TCP MD5 signature keys set with TCP_MD5SIG.
+	//
+	// +checklocks:md5Mu
+	md5Keys []md5Key
+
 	stats Stats
 
 	// tcpLingerTimeout is the maximum amount of a time a socket
@@ -579,6 +614,9 @@ type endpoint struct {
 	// for tcp.DefaultTCPTimeWaitTimeout seconds.
 	timeWaitTimer tcpip.Timer `state:"nosave"`
 
+	// timeWaitDeadline is when timeWaitTimer expires.
+	timeWaitDeadline tcpip.MonotonicTime `state:"nosave"`
+
 	// listenCtx is used by listening endpoints to store state used while listening for
 	// connections. Nil otherwise.
 	listenCtx *listenContext `state:"nosave"`
@@ -849,6 +887,7 @@ func newEndpoint(s *stack.Stack, protocol *protocol, netProto tcpip.NetworkProto
 		txHash:        s.Rand().Uint32(),
 		windowClamp:   DefaultReceiveBufferSize,
 		maxSynRetries: DefaultSynRetries,
+		maxRetries:    MaxRetries,
 	}
 	e.ops.InitHandler(e, e.stack, GetTCPSendBufferLimits, GetTCPReceiveBufferLimits)
 	e.ops.SetMulticastLoop(true)
@@ -891,6 +930,11 @@ func newEndpoint(s *stack.Stack, protocol *protocol, netProto tcpip.NetworkProto
 		e.maxSynRetries = uint8(synRetries)
 	}
 
+	var maxRetries tcpip.TCPMaxRetriesOption
+	if err := s.TransportProtocolOption(ProtocolNumber, &maxRetries); err == nil {
+		e.maxRetries = uint32(maxRetries)
+	}
+
 	if p := s.GetTCPProbe(); p != nil {
 		e.probe = p
 	}
@@ -915,8 +959,23 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 		// connected when SO_LINGER is set.
 		result |= waiter.EventHUp
 
-	case StateConnecting, StateSynSent, StateSynRecv:
-		// Ready for nothing.
+	case StateConnecting, StateSynRecv:
+		// Ready for nothing, except reading the data accepted by
+		// TCP Fast Open.
+		if (mask & waiter.ReadableEvents) != 0 {
+			e.rcvQueueMu.Lock()
+			if e.RcvBufUsed > 0 {
+				result |= waiter.ReadableEvents
+			}
+			e.rcvQueueMu.Unlock()
+		}
+
+	case StateSynSent:
+		// The handshake waits for the first write if it was deferred
+		// by TCPFastOpenConnectOption.
+		if e.fastOpenDeferred.Load() != 0 {
+			result |= mask & waiter.WritableEvents
+		}
 
 	case StateClose, StateError, StateTimeWait:
 		// Ready for anything.
@@ -932,6 +991,11 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 			e.acceptMu.Unlock()
 		}
 	}
+	// Like Linux, report an error if there are errors in the error queue, e.g.
+	// MSG_ZEROCOPY completion notifications.
+	if mask&waiter.EventErr != 0 && e.ops.HasQueuedErr() {
+		result |= waiter.EventErr
+	}
 	if e.EndpointState().connected() {
 		// Determine if the endpoint is writable if requested.
 		if (mask & waiter.WritableEvents) != 0 {
@@ -987,7 +1051,6 @@ func (e *endpoint) purgeReadQueue() {
 func (e *endpoint) purgeWriteQueue() {
 	if e.snd != nil {
 		e.sndQueueInfo.sndQueueMu.Lock()
-		defer e.sndQueueInfo.sndQueueMu.Unlock()
 		e.snd.updateWriteNext(nil)
 		for {
 			s := e.snd.writeList.Front()
@@ -999,6 +1062,13 @@ func (e *endpoint) purgeWriteQueue() {
 		}
 		e.sndQueueInfo.SndBufUsed = 0
 		e.sndQueueInfo.SndClosed = true
+		// The purged data won't be sent, so MSG_ZEROCOPY sends are complete.
+		e.sndQueueInfo.sndReleased = e.sndQueueInfo.sndQueued
+		zeroCopyDone := e.ops.ReleaseZeroCopySends(e.sndQueueInfo.sndReleased)
+		e.sndQueueInfo.sndQueueMu.Unlock()
+		if zeroCopyDone {
+			e.waiterQueue.Notify(waiter.EventErr)
+		}
 	}
 }
 
@@ -1130,6 +1200,7 @@ func (e *endpoint) closePendingAcceptableConnectionsLocked() {
 
 	pendingEndpoints := e.acceptQueue.pendingEndpoints
 	e.acceptQueue.pendingEndpoints = nil
+	e.acceptQueue.fastOpenEndpoints = nil
 
 	completedEndpoints := make([]*endpoint, 0, e.acceptQueue.endpoints.Len())
 	for n := e.acceptQueue.endpoints.Front(); n != nil; n = n.Next() {
@@ -1157,6 +1228,7 @@ func (e *endpoint) cleanupLocked() {
 		e.snd.resendTimer.cleanup()
 		e.snd.probeTimer.cleanup()
 		e.snd.reorderTimer.cleanup()
+		e.snd.pacingTimer.cleanup()
 	}
 
 	if e.finWait2Timer != nil {
@@ -1384,6 +1456,9 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 
 	var err error
 	done := 0
+	// receivedAt is the time at which the last segment that data was read
+	// from was received, which Linux reports as the timestamp of the read.
+	var receivedAt time.Time
 	// N.B. Here we get the first segment to be processed. It is safe to not
 	// hold rcvQueueMu when processing, since we hold e.mu to ensure we only
 	// remove segments from the list through Read() and that new segments
@@ -1394,6 +1469,9 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 		n, err = s.ReadTo(dst, opts.Peek)
 		// Book keeping first then error handling.
 		done += n
+		if n != 0 {
+			receivedAt = s.pkt.ReceivedAt
+		}
 
 		if opts.Peek {
 			s = s.Next()
@@ -1443,6 +1521,10 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 	return tcpip.ReadResult{
 		Count: done,
 		Total: done,
+		ControlMessages: tcpip.ReceivableControlMessages{
+			HasTimestamp: !receivedAt.IsZero(),
+			Timestamp:    receivedAt,
+		},
 	}, nil
 }
 
@@ -1599,6 +1681,14 @@ func (e *endpoint) queueSegment(p tcpip.Payloader, opts tcpip.WriteOptions) (*se
 	size := int(buf.Size())
 	s := newOutgoingSegment(e.TransportEndpointInfo.ID, e.stack.Clock(), buf)
 	e.sndQueueInfo.SndBufUsed += size
+	e.sndQueueInfo.sndQueued += uint64(size)
+	if opts.ZeroCopy {
+		e.ops.ExtendZeroCopySend(opts.ZeroCopyID, e.sndQueueInfo.sndQueued)
+	}
+	if e.ops.GetTimestamping()&tcpip.TimestampingTXSoftware != 0 {
+		s.txTimestamp = true
+		s.txTimestampKey = e.ops.StreamTimestampingKey(e.sndQueueInfo.sndQueued)
+	}
 	s.IncRef()
 	e.snd.writeList.PushBack(s)
 
@@ -1608,12 +1698,16 @@ func (e *endpoint) queueSegment(p tcpip.Payloader, opts tcpip.WriteOptions) (*se
 // Write writes data to the endpoint's peer.
 func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcpip.Error) {
 	// Linux completely ignores any address passed to sendto(2) for TCP sockets
-	// (without the MSG_FASTOPEN flag). Corking is unimplemented, so opts.More
+	// without the MSG_FASTOPEN flag. Corking is unimplemented, so opts.More
 	// and opts.EndOfRecord are also ignored.
 
 	e.LockUser()
 	defer e.UnlockUser()
 
+	if n, err, ok := e.fastOpenWriteLocked(p, opts); ok {
+		return n, err
+	}
+
 	// Return if either we didn't queue anything or if an error occurred while
 	// attempting to queue data.
 	nextSeg, n, err := e.queueSegment(p, opts)
@@ -1813,6 +1907,19 @@ func (e *endpoint) WakeupWriters() {
 	}
 }
 
+// OnTimestampingOptIDSet implements tcpip.SocketOptionsHandler.OnTimestampingOptIDSet.
+func (e *endpoint) OnTimestampingOptIDSet() (uint32, tcpip.Error) {
+	// As in Linux, keys are counted from the first unacknowledged byte, so
+	// the endpoint must be connecting or connected.
+	switch e.EndpointState() {
+	case StateInitial, StateBound, StateListen, StateClose, StateError:
+		return 0, &tcpip.ErrInvalidOptionValue{}
+	}
+	e.sndQueueInfo.sndQueueMu.Lock()
+	defer e.sndQueueInfo.sndQueueMu.Unlock()
+	return uint32(e.sndQueueInfo.sndReleased), nil
+}
+
 // SetSockOptInt sets a socket option.
 func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
 	// Lower 2 bits represents ECN bits. RFC 3168, section 23.1
@@ -1822,9 +1929,10 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
 	case tcpip.KeepaliveCountOption:
 		e.LockUser()
 		e.keepalive.Lock()
+		// As in Linux, the new count also applies to probes that are
+		// already unanswered.
 		e.keepalive.count = v
 		e.keepalive.Unlock()
-		e.resetKeepaliveTimer(true /* receivedData */)
 		e.UnlockUser()
 
 	case tcpip.IPv4TOSOption:
@@ -1875,6 +1983,37 @@ func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
 		e.maxSynRetries = uint8(v)
 		e.UnlockUser()
 
+	case tcpip.TCPFastOpenQueueLenOption:
+		if v < 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.LockUser()
+		switch e.EndpointState() {
+		case StateInitial, StateBound, StateListen:
+			e.fastOpenQueueLen = v
+			e.UnlockUser()
+		default:
+			e.UnlockUser()
+			return &tcpip.ErrInvalidEndpointState{}
+		}
+
+	case tcpip.TCPFastOpenConnectOption:
+		if v != 0 && v != 1 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		if v != 0 && !e.protocol.fastOpenEnabled(tcpip.TCPFastOpenClient) {
+			return &tcpip.ErrNotSupported{}
+		}
+		e.LockUser()
+		switch e.EndpointState() {
+		case StateInitial, StateBound:
+			e.fastOpenConnect = v != 0
+			e.UnlockUser()
+		default:
+			e.UnlockUser()
+			return &tcpip.ErrInvalidEndpointState{}
+		}
+
 	case tcpip.TCPWindowClampOption:
 		if v == 0 {
 			e.LockUser()
@@ -1910,18 +2049,15 @@ func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 	switch v := opt.(type) {
 	case *tcpip.KeepaliveIdleOption:
 		e.LockUser()
-		e.keepalive.Lock()
-		e.keepalive.idle = time.Duration(*v)
-		e.keepalive.Unlock()
-		e.resetKeepaliveTimer(true /* receivedData */)
+		e.setKeepaliveIdle(time.Duration(*v))
 		e.UnlockUser()
 
 	case *tcpip.KeepaliveIntervalOption:
 		e.LockUser()
+		// As in Linux, the new interval is used from the next probe.
 		e.keepalive.Lock()
 		e.keepalive.interval = time.Duration(*v)
 		e.keepalive.Unlock()
-		e.resetKeepaliveTimer(true /* receivedData */)
 		e.UnlockUser()
 
 	case *tcpip.TCPUserTimeoutOption:
@@ -1929,6 +2065,14 @@ func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 		e.userTimeout = time.Duration(*v)
 		e.UnlockUser()
 
+	case *tcpip.TCPMaxRetriesOption:
+		e.LockUser()
+		e.maxRetries = uint32(*v)
+		if e.snd != nil {
+			e.snd.maxRetries = e.maxRetries
+		}
+		e.UnlockUser()
+
 	case *tcpip.CongestionControlOption:
 		// Query the available cc algorithms in the stack and
 		// validate that the specified algorithm is actually
@@ -1989,8 +2133,25 @@ func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 		e.deferAccept = time.Duration(*v)
 		e.UnlockUser()
 
+	case *tcpip.TCPMD5SigOption:
+		if err := e.setMD5Key(v); err != nil {
+			return err
+		}
+		e.LockUser()
+		if e.md5KeyFor(e.TransportEndpointInfo.ID.RemoteAddress) != nil {
+			// Each segment must be signed individually, and has less
+			// room for data.
+			e.gso = stack.GSO{}
+			if e.snd != nil {
+				e.snd.ep.AssertLockHeld(e)
+				e.snd.gso = false
+				e.snd.updateMaxPayloadSize(int(e.route.MTU()), 0 /* count */)
+			}
+		}
+		e.UnlockUser()
+
 	case *tcpip.SocketDetachFilterOption:
-		return nil
+		return e.ops.DetachFilter()
 
 	default:
 		return nil
@@ -2051,6 +2212,12 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 	case tcpip.ReceiveQueueSizeOption:
 		return e.readyReceiveSize()
 
+	case tcpip.SendQueueSizeOption:
+		e.sndQueueInfo.sndQueueMu.Lock()
+		v := e.sndQueueInfo.SndBufUsed
+		e.sndQueueInfo.sndQueueMu.Unlock()
+		return v, nil
+
 	case tcpip.IPv4TTLOption:
 		e.LockUser()
 		v := int(e.ipv4TTL)
@@ -2075,6 +2242,21 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 		e.UnlockUser()
 		return v, nil
 
+	case tcpip.TCPFastOpenQueueLenOption:
+		e.LockUser()
+		v := e.fastOpenQueueLen
+		e.UnlockUser()
+		return v, nil
+
+	case tcpip.TCPFastOpenConnectOption:
+		e.LockUser()
+		v := e.fastOpenConnect
+		e.UnlockUser()
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+
 	case tcpip.MulticastTTLOption:
 		return 1, nil
 
@@ -2106,17 +2288,102 @@ func (e *endpoint) getTCPInfo() tcpip.TCPInfoOption {
 		info.SndSsthresh = uint32(snd.Ssthresh)
 		info.SndCwnd = uint32(snd.SndCwnd)
 		info.ReorderSeen = snd.rc.Reord
-	}
+		info.Retransmits = snd.rtoRetransmits
+		info.TotalRetransmits = snd.totalRetransmits
+		info.SndWndScale = snd.SndWndScale
+		info.SndMSS = uint32(snd.MaxPayloadSize)
+		info.Unacked = uint32(snd.Outstanding)
+		info.Sacked = uint32(snd.SackedOut)
+		info.MinRTT = snd.minRTT
+		info.BytesSent = snd.bytesSent
+		info.BytesRetransmitted = snd.bytesRetransmitted
+		info.BytesAcked = snd.bytesAcked
+		info.DeliveryRate = snd.deliveryRate
+		info.PacingRate = snd.pacingRate(info.RTT)
+		if maxRate := e.ops.GetMaxPacingRate(); info.PacingRate > maxRate {
+			info.PacingRate = maxRate
+		}
+		for seg := snd.writeNext; seg != nil; seg = seg.Next() {
+			info.NotSentBytes += uint32(seg.payloadSize())
+		}
+	}
+	if rcv := e.rcv; rcv != nil {
+		info.RcvWndScale = rcv.RcvWndScale
+		info.BytesReceived = rcv.bytesReceived
+	}
+	info.Timestamps = e.SendTSOk
+	info.SACKPermitted = e.SACKPermitted
+	info.AdvMSS = uint32(e.amss)
+	info.SegmentsSent = e.stats.SegmentsSent.Value()
+	info.SegmentsReceived = e.stats.SegmentsReceived.Value()
 	e.UnlockUser()
 	return info
 }
 
+// getTCPStatus returns the queue lengths and pending timer of e.
+func (e *endpoint) getTCPStatus() tcpip.TCPStatusOption {
+	var status tcpip.TCPStatusOption
+	e.LockUser()
+	defer e.UnlockUser()
+
+	now := e.stack.Clock().NowMonotonic()
+	switch e.EndpointState() {
+	case StateListen:
+		e.acceptMu.Lock()
+		status.ReceiveQueue = uint32(e.acceptQueue.endpoints.Len())
+		status.SendQueue = uint32(e.acceptQueue.capacity)
+		e.acceptMu.Unlock()
+		return status
+	case StateTimeWait:
+		if e.timeWaitTimer != nil {
+			status.Timer = tcpip.TCPTimerTimeWait
+			status.TimerExpires = e.timeWaitDeadline.Sub(now)
+		}
+		return status
+	}
+
+	e.rcvQueueMu.Lock()
+	status.ReceiveQueue = uint32(e.RcvBufUsed)
+	e.rcvQueueMu.Unlock()
+	e.sndQueueInfo.sndQueueMu.Lock()
+	status.SendQueue = uint32(e.sndQueueInfo.SndBufUsed)
+	e.sndQueueInfo.sndQueueMu.Unlock()
+
+	// As in Linux, a pending retransmission or probe is reported in
+	// preference to keepalives.
+	if snd := e.snd; snd != nil {
+		status.ZeroWindowProbes = snd.unackZeroWindowProbes
+		switch {
+		case snd.resendTimer.enabled():
+			status.Timer = tcpip.TCPTimerRetransmit
+			if snd.zeroWindowProbing {
+				status.Timer = tcpip.TCPTimerZeroWindowProbe
+			}
+			status.TimerExpires = snd.resendTimer.target.Sub(now)
+		case snd.probeTimer.enabled():
+			status.Timer = tcpip.TCPTimerRetransmit
+			status.TimerExpires = snd.probeTimer.target.Sub(now)
+		}
+	}
+	if status.Timer == tcpip.TCPTimerNone && e.keepalive.timer.enabled() {
+		status.Timer = tcpip.TCPTimerKeepalive
+		status.TimerExpires = e.keepalive.timer.target.Sub(now)
+	}
+	if status.TimerExpires < 0 {
+		status.TimerExpires = 0
+	}
+	return status
+}
+
 // GetSockOpt implements tcpip.Endpoint.GetSockOpt.
 func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) tcpip.Error {
 	switch o := opt.(type) {
 	case *tcpip.TCPInfoOption:
 		*o = e.getTCPInfo()
 
+	case *tcpip.TCPStatusOption:
+		*o = e.getTCPStatus()
+
 	case *tcpip.KeepaliveIdleOption:
 		e.keepalive.Lock()
 		*o = tcpip.KeepaliveIdleOption(e.keepalive.idle)
@@ -2132,6 +2399,11 @@ func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) tcpip.Error {
 		*o = tcpip.TCPUserTimeoutOption(e.userTimeout)
 		e.UnlockUser()
 
+	case *tcpip.TCPMaxRetriesOption:
+		e.LockUser()
+		*o = tcpip.TCPMaxRetriesOption(e.maxRetries)
+		e.UnlockUser()
+
 	case *tcpip.CongestionControlOption:
 		e.LockUser()
 		*o = e.cc
@@ -2151,6 +2423,12 @@ func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) tcpip.Error {
 		e.LockUser()
 		ipt := e.stack.IPTables()
 		addr, port, err := ipt.OriginalDst(e.TransportEndpointInfo.ID, e.NetProto, ProtocolNumber)
+		if err != nil && e.ops.GetTransparent() && e.EndpointState().connected() {
+			// Connections accepted by transparent sockets, e.g. because
+			// they were diverted by the TPROXY target, are to their
+			// original destination.
+			addr, port, err = e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.LocalPort, nil
+		}
 		e.UnlockUser()
 		if err != nil {
 			return err
@@ -2186,7 +2464,7 @@ func (*endpoint) Disconnect() tcpip.Error {
 func (e *endpoint) Connect(addr tcpip.FullAddress) tcpip.Error {
 	e.LockUser()
 	defer e.UnlockUser()
-	err := e.connect(addr, true)
+	err := e.connect(addr, true, nil)
 	if err != nil {
 		if !err.IgnoreStats() {
 			// Connect failed. Let's wake up any waiters.
@@ -2356,7 +2634,7 @@ func (e *endpoint) registerEndpoint(addr tcpip.FullAddress, netProto tcpip.Netwo
 
 // connect connects the endpoint to its peer.
 // +checklocks:e.mu
-func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
+func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool, fastOpen tcpip.Payloader) tcpip.Error {
 	connectingAddr := addr.Addr
 
 	addr, netProto, err := e.checkV4MappedLocked(addr)
@@ -2409,11 +2687,60 @@ func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
 		return &tcpip.ErrInvalidEndpointState{}
 	}
 
-	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, e.TransportEndpointInfo.ID.LocalAddress, addr.Addr, netProto, false /* multicastLoop */)
+	// An endpoint bound to a device may only connect through that device,
+	// regardless of the route table.
+	bindToDevice := tcpip.NICID(e.ops.GetBindToDevice())
+	if bindToDevice != 0 {
+		if nicID != 0 && nicID != bindToDevice {
+			return &tcpip.ErrHostUnreachable{}
+		}
+		nicID = bindToDevice
+	}
+	findRoute := func(remoteAddr tcpip.Address) (*stack.Route, tcpip.Error) {
+		if e.ops.GetTransparent() {
+			return e.stack.FindTransparentRoute(nicID, e.TransportEndpointInfo.ID.LocalAddress, remoteAddr, netProto, false /* multicastLoop */)
+		}
+		if bindToDevice != 0 {
+			return e.stack.FindRouteThroughNIC(nicID, e.TransportEndpointInfo.ID.LocalAddress, remoteAddr, netProto, false /* multicastLoop */)
+		}
+		// Find a route to the desired destination.
+		return e.stack.FindRoute(nicID, e.TransportEndpointInfo.ID.LocalAddress, remoteAddr, netProto, false /* multicastLoop */)
+	}
+	r, err := findRoute(addr.Addr)
 	if err != nil {
 		return err
 	}
+
+	// Connections re-established during restore were already allowed.
+	if hook := e.stack.GetTCPConnectHook(); hook != nil && handshake {
+		d := hook(stack.TCPConnectRequest{
+			NetProto: netProto,
+			NICID:    r.NICID(),
+			ID: stack.TransportEndpointID{
+				LocalPort:     e.TransportEndpointInfo.ID.LocalPort,
+				LocalAddress:  r.LocalAddress(),
+				RemotePort:    addr.Port,
+				RemoteAddress: r.RemoteAddress(),
+			},
+			Owner: e.owner,
+		})
+		switch d.Verdict {
+		case stack.TCPConnectAllow:
+		case stack.TCPConnectRedirect:
+			r.Release()
+			if len(d.Redirect.Addr) != len(addr.Addr) {
+				return &tcpip.ErrNetworkUnreachable{}
+			}
+			addr.Addr = d.Redirect.Addr
+			addr.Port = d.Redirect.Port
+			if r, err = findRoute(addr.Addr); err != nil {
+				return err
+			}
+		default:
+			r.Release()
+			return &tcpip.ErrConnectionRefused{}
+		}
+	}
 	defer r.Release()
 
 	e.TransportEndpointInfo.ID.LocalAddress = r.LocalAddress()
@@ -2459,6 +2786,12 @@ func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
 	// Start a new handshake.
 	h := e.newHandshake()
 	e.setEndpointState(StateSynSent)
+	if (fastOpen != nil || e.fastOpenConnect) && h.initFastOpenLocked(fastOpen) {
+		// Connect appears to succeed immediately, and the handshake is
+		// started by the first write.
+		e.stack.Stats().TCP.ActiveConnectionOpenings.Increment()
+		return nil
+	}
 	h.start()
 	e.stack.Stats().TCP.ActiveConnectionOpenings.Increment()
 
@@ -2595,6 +2928,9 @@ func (e *endpoint) listen(backlog int) tcpip.Error {
 		if e.acceptQueue.pendingEndpoints == nil {
 			e.acceptQueue.pendingEndpoints = make(map[*endpoint]struct{})
 		}
+		if e.acceptQueue.fastOpenEndpoints == nil {
+			e.acceptQueue.fastOpenEndpoints = make(map[*endpoint]struct{})
+		}
 
 		e.shutdownFlags = 0
 		e.rcvQueueMu.Lock()
@@ -2639,6 +2975,9 @@ func (e *endpoint) listen(backlog int) tcpip.Error {
 	if e.acceptQueue.pendingEndpoints == nil {
 		e.acceptQueue.pendingEndpoints = make(map[*endpoint]struct{})
 	}
+	if e.acceptQueue.fastOpenEndpoints == nil {
+		e.acceptQueue.fastOpenEndpoints = make(map[*endpoint]struct{})
+	}
 	if e.acceptQueue.capacity == 0 {
 		e.acceptQueue.capacity = backlog
 	}
@@ -2725,7 +3064,13 @@ func (e *endpoint) bindLocked(addr tcpip.FullAddress) (err tcpip.Error) {
 	if len(addr.Addr) != 0 {
 		nic = e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
 		if nic == 0 {
-			return &tcpip.ErrBadLocalAddress{}
+			// With IP_FREEBIND, the address may be assigned to an interface
+			// after the endpoint is bound. With IP_TRANSPARENT, it need never
+			// be.
+			if !e.ops.GetFreeBind() && !e.ops.GetTransparent() {
+				return &tcpip.ErrBadLocalAddress{}
+			}
+			nic = addr.NIC
 		}
 		e.TransportEndpointInfo.ID.LocalAddress = addr.Addr
 	}
@@ -2868,6 +3213,7 @@ func (e *endpoint) onICMPError(err tcpip.Error, transErr stack.TransportError, p
 			// Remove from listening endpoints pending list.
 			lEP.acceptMu.Lock()
 			delete(lEP.acceptQueue.pendingEndpoints, e)
+			delete(lEP.acceptQueue.fastOpenEndpoints, e)
 			lEP.acceptMu.Unlock()
 			lEP.stats.FailedConnectionAttempts.Increment()
 		}
@@ -2919,6 +3265,8 @@ func (e *endpoint) updateSndBufferUsage(v int) {
 	e.sndQueueInfo.sndQueueMu.Lock()
 	notify := e.sndQueueInfo.SndBufUsed >= sendBufferSize>>1
 	e.sndQueueInfo.SndBufUsed -= v
+	e.sndQueueInfo.sndReleased += uint64(v)
+	zeroCopyDone := e.ops.ReleaseZeroCopySends(e.sndQueueInfo.sndReleased)
 
 	// Get the new send buffer size with auto tuning, but do not set it
 	// unless we decide to notify the writers.
@@ -2930,6 +3278,10 @@ func (e *endpoint) updateSndBufferUsage(v int) {
 	notify = notify && e.sndQueueInfo.SndBufUsed < int(newSndBufSz)>>1
 	e.sndQueueInfo.sndQueueMu.Unlock()
 
+	if zeroCopyDone {
+		e.waiterQueue.Notify(waiter.EventErr)
+	}
+
 	if notify {
 		// Set the new send buffer size calculated from auto tuning.
 		e.ops.SetSendBufferSize(newSndBufSz, false /* notify */)
@@ -3075,7 +3427,7 @@ func (e *endpoint) maybeEnableSACKPermitted(synOpts header.TCPSynOptions) {
 // maxOptionSize return the maximum size of TCP options.
 func (e *endpoint) maxOptionSize() (size int) {
 	var maxSackBlocks [header.TCPMaxSACKBlocks]header.SACKBlock
-	options := e.makeOptions(maxSackBlocks[:])
+	options := e.makeOptions(maxSackBlocks[:], e.md5KeyFor(e.TransportEndpointInfo.ID.RemoteAddress) != nil)
 	size = len(options)
 	putOptions(options)
 
@@ -3141,7 +3493,19 @@ func (e *endpoint) initHostGSO() {
 }
 
 func (e *endpoint) initGSO() {
-	if e.route.HasHostGSOCapability() {
+	if e.md5KeyFor(e.TransportEndpointInfo.ID.RemoteAddress) != nil {
+		// Each segment must be signed individually.
+		return
+	}
+	if e.route.HasLocalGSOCapability() {
+		// Segments never leave the stack, so they can be as large as the
+		// network protocol allows regardless of the MTU.
+		e.gso = stack.GSO{
+			MaxSize:   stack.LocalGSOMaxSize,
+			Type:      stack.GSOGvisor,
+			NeedsCsum: false,
+		}
+	} else if e.route.HasHostGSOCapability() {
 		e.initHostGSO()
 	} else if e.route.HasGvisorGSOCapability() {
 		e.gso = stack.GSO{
@@ -131,11 +131,15 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		snd.resendTimer.init(s.Clock(), maybeFailTimerHandler(e, e.snd.retransmitTimerExpired))
 		snd.reorderTimer.init(s.Clock(), timerHandler(e, e.snd.rc.reorderTimerExpired))
 		snd.probeTimer.init(s.Clock(), timerHandler(e, e.snd.probeTimerExpired))
+		snd.pacingTimer.init(s.Clock(), timerHandler(e, e.snd.pacingTimerExpired))
 	}
 	e.stack = s
 	e.protocol = protocolFromStack(s)
 	e.ops.InitHandler(e, e.stack, GetTCPSendBufferLimits, GetTCPReceiveBufferLimits)
 	e.segmentQueue.thaw()
+	e.mu.Lock()
+	e.rewriteRestoredAddressesLocked()
+	e.mu.Unlock()
 	epState := EndpointState(e.origEndpointState)
 	switch epState {
 	case StateInitial, StateBound, StateListen, StateConnecting, StateEstablished:
@@ -197,9 +201,15 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		// we do not restore SACK information.
 		e.scoreboard.Reset()
 		e.mu.Lock()
-		err := e.connect(tcpip.FullAddress{NIC: e.boundNICID, Addr: e.connectingAddress, Port: e.TransportEndpointInfo.ID.RemotePort}, false /* handshake */)
+		err := e.connect(tcpip.FullAddress{NIC: e.boundNICID, Addr: e.connectingAddress, Port: e.TransportEndpointInfo.ID.RemotePort}, false /* handshake */, nil /* fastOpen */)
 		if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
-			panic("endpoint connecting failed: " + err.String())
+			// The connection can't be resumed on this stack, e.g. because
+			// the stack was restored with different addresses. Reset it,
+			// so that it fails with ECONNRESET the next time it is used.
+			e.resetRestoredConnectionLocked()
+			e.mu.Unlock()
+			connectedLoading.Done()
+			return
 		}
 		e.state.Store(e.origEndpointState)
 		// For FIN-WAIT-2 and TIME-WAIT we need to start the appropriate timers so
@@ -208,7 +218,9 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		case StateFinWait2:
 			e.finWait2Timer = e.stack.Clock().AfterFunc(e.tcpLingerTimeout, e.finWait2TimerExpired)
 		case StateTimeWait:
-			e.timeWaitTimer = e.stack.Clock().AfterFunc(e.getTimeWaitDuration(), e.timeWaitTimerExpired)
+			timeWaitDuration := e.getTimeWaitDuration()
+			e.timeWaitDeadline = e.stack.Clock().NowMonotonic().Add(timeWaitDuration)
+			e.timeWaitTimer = e.stack.Clock().AfterFunc(timeWaitDuration, e.timeWaitTimerExpired)
 		}
 
 		e.mu.Unlock()
@@ -256,9 +268,17 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		e.mu.Lock()
 		defer e.mu.Unlock()
 		e.setEndpointState(epState)
-		r, err := e.stack.FindRoute(e.boundNICID, e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.RemoteAddress, e.effectiveNetProtos[0], false /* multicastLoop */)
+		findRoute := e.stack.FindRoute
+		if e.ops.GetTransparent() {
+			findRoute = e.stack.FindTransparentRoute
+		}
+		r, err := findRoute(e.boundNICID, e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.RemoteAddress, e.effectiveNetProtos[0], false /* multicastLoop */)
 		if err != nil {
-			panic(fmt.Sprintf("FindRoute failed when restoring endpoint w/ ID: %+v", e.ID))
+			// As for connected endpoints, reset connections that can't be
+			// resumed on this stack.
+			e.resetRestoredConnectionLocked()
+			connectingLoading.Done()
+			return
 		}
 		e.route = r
 		timer, err := newBackoffTimer(e.stack.Clock(), InitialRTO, MaxRTO, maybeFailTimerHandler(e, e.h.retransmitHandlerLocked))
@@ -287,3 +307,35 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		tcpip.DeleteDanglingEndpoint(e)
 	}
 }
+
+// rewriteRestoredAddressesLocked applies the restore subnet rewrites of the
+// endpoint's stack to its local addresses. Connections whose remote address
+// is their own local address are looped back, so their remote address is
+// rewritten as well.
+//
+// +checklocks:e.mu
+func (e *endpoint) rewriteRestoredAddressesLocked() {
+	id := &e.TransportEndpointInfo.ID
+	if len(id.LocalAddress) != 0 {
+		localAddr := e.stack.RewriteRestoredAddress(id.LocalAddress)
+		if id.RemoteAddress == id.LocalAddress {
+			id.RemoteAddress = localAddr
+			e.connectingAddress = e.stack.RewriteRestoredAddress(e.connectingAddress)
+		}
+		id.LocalAddress = localAddr
+	}
+	e.BindAddr = e.stack.RewriteRestoredAddress(e.BindAddr)
+}
+
+// resetRestoredConnectionLocked resets a connected endpoint that couldn't be
+// resumed. Unlike resetConnectionLocked, it doesn't send a RST, since the
+// endpoint has no route.
+//
+// +checklocks:e.mu
+func (e *endpoint) resetRestoredConnectionLocked() {
+	e.hardError = &tcpip.ErrConnectionReset{}
+	e.purgeWriteQueue()
+	e.purgePendingRcvQueue()
+	e.cleanupLocked()
+	e.setEndpointState(StateError)
+}
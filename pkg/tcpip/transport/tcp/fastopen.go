@@ -0,0 +1,404 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// fastOpenCookieSize is the size of the TCP Fast Open cookies generated
+	// for peers. Linux also uses 8 byte cookies.
+	fastOpenCookieSize = 8
+
+	// fastOpenKeySize is the size of the keys used to generate cookies.
+	fastOpenKeySize = 16
+
+	// fastOpenKeyLifetime is the time after which cookies are generated with
+	// a new key. Cookies generated with the previous key are still accepted,
+	// so that peers have time to learn the new cookie.
+	fastOpenKeyLifetime = time.Hour
+
+	// maxFastOpenCookies is the maximum number of peers for which cookies are
+	// cached.
+	maxFastOpenCookies = 1024
+)
+
+// fastOpenKeys holds the keys used to generate and validate the TCP Fast Open
+// cookies given to peers, as described in RFC 7413, section 4.1.2.
+type fastOpenKeys struct {
+	stack *stack.Stack
+
+	mu sync.Mutex
+
+	// keys holds the current key, used to generate cookies, followed by the
+	// previous key.
+	//
+	// +checklocks:mu
+	keys [2][fastOpenKeySize]byte
+
+	// rotated is the time at which the current key was generated.
+	//
+	// +checklocks:mu
+	rotated tcpip.MonotonicTime
+}
+
+func (k *fastOpenKeys) init(s *stack.Stack) {
+	k.stack = s
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.newKeyLocked(&k.keys[0])
+	k.newKeyLocked(&k.keys[1])
+	k.rotated = s.Clock().NowMonotonic()
+}
+
+// +checklocks:k.mu
+func (k *fastOpenKeys) newKeyLocked(key *[fastOpenKeySize]byte) {
+	if _, err := io.ReadFull(k.stack.SecureRNG(), key[:]); err != nil {
+		panic(err)
+	}
+}
+
+// maybeRotateLocked replaces the current key with a new one if it has
+// expired.
+//
+// +checklocks:k.mu
+func (k *fastOpenKeys) maybeRotateLocked() {
+	now := k.stack.Clock().NowMonotonic()
+	elapsed := now.Sub(k.rotated)
+	if elapsed < fastOpenKeyLifetime {
+		return
+	}
+	if elapsed < 2*fastOpenKeyLifetime {
+		k.keys[1] = k.keys[0]
+	} else {
+		// Cookies generated with the current key have expired as well.
+		k.newKeyLocked(&k.keys[1])
+	}
+	k.newKeyLocked(&k.keys[0])
+	k.rotated = now
+}
+
+func fastOpenCookieWithKey(key *[fastOpenKeySize]byte, local, remote tcpip.Address) []byte {
+	mac := hmac.New(sha256.New, key[:])
+	// Per hash.Hash.Writer:
+	//
+	// It never returns an error.
+	_, _ = mac.Write([]byte(local))
+	_, _ = mac.Write([]byte(remote))
+	return mac.Sum(nil)[:fastOpenCookieSize]
+}
+
+// cookie returns the cookie to be given to remote for connections to local.
+func (k *fastOpenKeys) cookie(local, remote tcpip.Address) []byte {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.maybeRotateLocked()
+	return fastOpenCookieWithKey(&k.keys[0], local, remote)
+}
+
+// valid returns true if cookie was given to remote for connections to local
+// and hasn't expired.
+func (k *fastOpenKeys) valid(local, remote tcpip.Address, cookie []byte) bool {
+	if len(cookie) != fastOpenCookieSize {
+		return false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.maybeRotateLocked()
+	for i := range k.keys {
+		if hmac.Equal(cookie, fastOpenCookieWithKey(&k.keys[i], local, remote)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fastOpenCookieCache caches the TCP Fast Open cookies received from peers, as
+// described in RFC 7413, section 4.1.3.
+type fastOpenCookieCache struct {
+	mu sync.Mutex
+
+	// +checklocks:mu
+	cookies map[tcpip.Address][]byte
+}
+
+// get returns the cookie cached for addr, or nil if there is none.
+func (c *fastOpenCookieCache) get(addr tcpip.Address) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cookies[addr]
+}
+
+// put caches a copy of cookie for addr.
+func (c *fastOpenCookieCache) put(addr tcpip.Address, cookie []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cookies == nil {
+		c.cookies = make(map[tcpip.Address][]byte)
+	}
+	if _, ok := c.cookies[addr]; !ok && len(c.cookies) >= maxFastOpenCookies {
+		// Evict an arbitrary peer to make room.
+		for a := range c.cookies {
+			delete(c.cookies, a)
+			break
+		}
+	}
+	c.cookies[addr] = append([]byte(nil), cookie...)
+}
+
+// remove forgets the cookie cached for addr, if any.
+func (c *fastOpenCookieCache) remove(addr tcpip.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.cookies, addr)
+}
+
+// fastOpenEnabled returns true if TCP Fast Open is enabled for the given
+// roles.
+func (p *protocol) fastOpenEnabled(role tcpip.TCPFastOpenOption) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.fastOpen&role == role
+}
+
+// passiveFastOpen describes how the TCP Fast Open option of a SYN received
+// by a listening endpoint is handled.
+type passiveFastOpen struct {
+	// cookie, if not nil, is sent to the peer in the SYN-ACK.
+	cookie []byte
+
+	// acceptData is true if the peer's cookie is valid, in which case the
+	// data in the SYN is accepted and the new endpoint is delivered to the
+	// accept queue before the handshake completes.
+	acceptData bool
+}
+
+// fastOpenSYNLocked decides how the TCP Fast Open option of the SYN s, with
+// options opts, is handled by the listening endpoint e.
+//
+// +checklocks:e.mu
+// +checklocks:e.acceptMu
+func (e *endpoint) fastOpenSYNLocked(s *segment, opts *header.TCPSynOptions) passiveFastOpen {
+	if !opts.FastOpen || e.fastOpenQueueLen == 0 || !e.protocol.fastOpenEnabled(tcpip.TCPFastOpenServer) {
+		return passiveFastOpen{}
+	}
+	// There is no room for the option alongside a TCP MD5 signature.
+	if e.md5KeyFor(s.id.RemoteAddress) != nil {
+		return passiveFastOpen{}
+	}
+
+	stats := e.stack.Stats().TCP
+	local, remote := s.id.LocalAddress, s.id.RemoteAddress
+	switch {
+	case len(opts.FastOpenCookie) == 0:
+		stats.FastOpenCookieReqd.Increment()
+		return passiveFastOpen{cookie: e.protocol.fastOpenKeys.cookie(local, remote)}
+	case !e.protocol.fastOpenKeys.valid(local, remote, opts.FastOpenCookie):
+		// Give the peer a fresh cookie to use for its next connection.
+		stats.FastOpenPassiveFail.Increment()
+		return passiveFastOpen{cookie: e.protocol.fastOpenKeys.cookie(local, remote)}
+	case len(e.acceptQueue.fastOpenEndpoints) >= e.fastOpenQueueLen:
+		// Fall back to a regular handshake.
+		stats.FastOpenListenOverflow.Increment()
+		return passiveFastOpen{}
+	default:
+		stats.FastOpenPassive.Increment()
+		return passiveFastOpen{acceptData: true}
+	}
+}
+
+// acceptFastOpenDataLocked accepts the data in the SYN s, which carried a
+// valid TCP Fast Open cookie, without waiting for the handshake to complete.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) acceptFastOpenDataLocked(s *segment) {
+	h.fastOpenAccepted = true
+	if s.payloadSize() == 0 {
+		return
+	}
+	h.ackNum = h.ackNum.Add(seqnum.Size(s.payloadSize()))
+	d := s.clone()
+	d.setOwner(h.ep, recvQ)
+	h.ep.readyToRead(d)
+	d.DecRef()
+}
+
+// initFastOpenLocked prepares the SYN of the active open h to carry a TCP Fast
+// Open option, if it can. p is the data to be sent in the SYN, or nil if the
+// connection was initiated by Connect with TCPFastOpenConnectOption set.
+//
+// It returns true if the handshake must wait for the first write, whose data
+// is sent in the SYN.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) initFastOpenLocked(p tcpip.Payloader) bool {
+	e := h.ep
+	remote := e.TransportEndpointInfo.ID.RemoteAddress
+	if !e.protocol.fastOpenEnabled(tcpip.TCPFastOpenClient) || e.md5KeyFor(remote) != nil {
+		return false
+	}
+	h.sendFastOpen = true
+	h.fastOpenCookie = e.protocol.fastOpenCookies.get(remote)
+	if h.fastOpenCookie == nil {
+		// Request a cookie; any data is sent once the connection is
+		// established.
+		return false
+	}
+	if p == nil {
+		h.deferred = true
+		h.retransmitTimer.stop()
+		e.fastOpenDeferred.Store(1)
+		return true
+	}
+	h.readSYNDataLocked(p)
+	return false
+}
+
+// readSYNDataLocked reads the data to be sent in the SYN of h from p. As in
+// Linux, the SYN is sent without data if p can't be read.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) readSYNDataLocked(p tcpip.Payloader) {
+	// The data must fit in a single segment along with the SYN options.
+	avail := int(calculateAdvertisedMSS(h.ep.userMSS, h.ep.route)) - maxOptionSize
+	if sndBufSize := h.ep.getSendBufferSize(); sndBufSize < avail {
+		avail = sndBufSize
+	}
+	if l := p.Len(); l < avail {
+		avail = l
+	}
+	if avail <= 0 {
+		return
+	}
+	if _, err := h.synData.WriteFromReader(p, int64(avail)); err != nil {
+		h.synData.Release()
+		return
+	}
+	h.ep.stack.Stats().TCP.FastOpenActive.Increment()
+}
+
+// startDeferredLocked starts the handshake deferred by initFastOpenLocked,
+// sending the data in p in the SYN.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) startDeferredLocked(p tcpip.Payloader) {
+	h.deferred = false
+	h.ep.fastOpenDeferred.Store(0)
+	h.readSYNDataLocked(p)
+	h.retransmitTimer.t.Reset(h.retransmitTimer.timeout)
+	h.start()
+}
+
+// fastOpenSYNACKLocked handles the TCP Fast Open option, with options opts,
+// of the SYN-ACK s received by the active open h. Any data sent in the SYN
+// that s doesn't acknowledge is left in h.synData to be retransmitted once the
+// connection is established.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) fastOpenSYNACKLocked(s *segment, opts header.TCPSynOptions) {
+	if !h.sendFastOpen {
+		return
+	}
+	e := h.ep
+	remote := e.TransportEndpointInfo.ID.RemoteAddress
+	if opts.FastOpen && len(opts.FastOpenCookie) != 0 {
+		e.protocol.fastOpenCookies.put(remote, opts.FastOpenCookie)
+	}
+	if h.synData.Size() == 0 {
+		return
+	}
+	if acked := h.iss.Add(1).Size(s.ackNumber); acked > 0 {
+		h.synData.TrimFront(int64(acked))
+		h.iss = h.iss.Add(acked)
+	}
+	if h.synData.Size() != 0 {
+		e.stack.Stats().TCP.FastOpenActiveFail.Increment()
+		if !opts.FastOpen {
+			// The peer doesn't support TCP Fast Open, or no longer
+			// accepts our cookie.
+			e.protocol.fastOpenCookies.remove(remote)
+		}
+	}
+}
+
+// retransmitSYNDataLocked queues the data sent in the SYN that the peer didn't
+// acknowledge for retransmission.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) retransmitSYNDataLocked() {
+	if h.synData.Size() == 0 {
+		return
+	}
+	e := h.ep
+	size := int(h.synData.Size())
+	s := newOutgoingSegment(e.TransportEndpointInfo.ID, e.stack.Clock(), h.synData)
+	h.synData = bufferv2.Buffer{}
+	e.sndQueueInfo.sndQueueMu.Lock()
+	e.sndQueueInfo.SndBufUsed += size
+	e.sndQueueInfo.sndQueued += uint64(size)
+	e.sndQueueInfo.sndQueueMu.Unlock()
+	e.snd.writeList.PushBack(s)
+	e.sendData(s)
+}
+
+// fastOpenWriteLocked handles a write that initiates a connection, because
+// it is sent with MSG_FASTOPEN or because the handshake was deferred by
+// TCPFastOpenConnectOption. ok is false if the write must be handled as a
+// regular write.
+//
+// +checklocks:e.mu
+func (e *endpoint) fastOpenWriteLocked(p tcpip.Payloader, opts tcpip.WriteOptions) (n int64, err tcpip.Error, ok bool) {
+	if h := e.h; h != nil && h.deferred {
+		h.startDeferredLocked(p)
+		return h.synData.Size(), nil, true
+	}
+	if !opts.FastOpen {
+		return 0, nil, false
+	}
+	if !e.protocol.fastOpenEnabled(tcpip.TCPFastOpenClient) {
+		return 0, &tcpip.ErrNotSupported{}, true
+	}
+	if e.EndpointState().connected() {
+		return 0, &tcpip.ErrAlreadyConnected{}, true
+	}
+	if opts.To == nil {
+		return 0, &tcpip.ErrDestinationRequired{}, true
+	}
+	err = e.connect(*opts.To, true, p)
+	if _, ok := err.(*tcpip.ErrConnectStarted); ok {
+		if n := e.h.synData.Size(); n != 0 {
+			return n, nil, true
+		}
+		return 0, err, true
+	}
+	if err != nil && !err.IgnoreStats() {
+		e.waiterQueue.Notify(waiter.EventHUp | waiter.EventErr | waiter.ReadableEvents | waiter.WritableEvents)
+		e.stack.Stats().TCP.FailedConnectionAttempts.Increment()
+		e.stats.FailedConnectionAttempts.Increment()
+	}
+	return 0, err, true
+}
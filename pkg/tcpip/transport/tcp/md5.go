@@ -0,0 +1,190 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// maxMD5KeyLen is the maximum length of a TCP MD5 signature key, as in Linux's
+// TCP_MD5SIG_MAXKEYLEN.
+const maxMD5KeyLen = 80
+
+// md5OptionSize is the size of the TCP MD5 signature option, including the two
+// NOPs that precede it to keep the following options aligned.
+const md5OptionSize = 2 + header.TCPOptionMD5SigLength
+
+// md5Key is a TCP MD5 signature key (RFC 2385) for the peers whose addresses
+// match the first prefixLen bits of addr.
+//
+// +stateify savable
+type md5Key struct {
+	addr      tcpip.Address
+	prefixLen int
+	key       []byte
+}
+
+// matches returns true if addr is within k's address prefix.
+func (k *md5Key) matches(addr tcpip.Address) bool {
+	if len(addr) != len(k.addr) {
+		return false
+	}
+	n := k.prefixLen / 8
+	if addr[:n] != k.addr[:n] {
+		return false
+	}
+	if bits := k.prefixLen % 8; bits != 0 {
+		mask := byte(0xff << (8 - bits))
+		return addr[n]&mask == k.addr[n]&mask
+	}
+	return true
+}
+
+// setMD5Key implements SetSockOpt for tcpip.TCPMD5SigOption.
+func (e *endpoint) setMD5Key(opt *tcpip.TCPMD5SigOption) tcpip.Error {
+	if opt.PrefixLen < 0 || opt.PrefixLen > len(opt.Addr)*8 || len(opt.Key) > maxMD5KeyLen {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+
+	e.md5Mu.Lock()
+	defer e.md5Mu.Unlock()
+	for i := range e.md5Keys {
+		k := &e.md5Keys[i]
+		if k.addr != opt.Addr || k.prefixLen != opt.PrefixLen {
+			continue
+		}
+		if len(opt.Key) == 0 {
+			e.md5Keys = append(e.md5Keys[:i], e.md5Keys[i+1:]...)
+		} else {
+			k.key = append([]byte(nil), opt.Key...)
+		}
+		return nil
+	}
+	if len(opt.Key) == 0 {
+		// Linux returns ENOENT when removing a key that doesn't exist.
+		return &tcpip.ErrNoSuchFile{}
+	}
+	e.md5Keys = append(e.md5Keys, md5Key{
+		addr:      opt.Addr,
+		prefixLen: opt.PrefixLen,
+		key:       append([]byte(nil), opt.Key...),
+	})
+	return nil
+}
+
+// md5KeyFor returns the key used for segments exchanged with the peer with the
+// given address, or nil if there is none. As in Linux, the key with the
+// longest matching prefix is used.
+func (e *endpoint) md5KeyFor(addr tcpip.Address) []byte {
+	e.md5Mu.Lock()
+	defer e.md5Mu.Unlock()
+	var (
+		key       []byte
+		prefixLen = -1
+	)
+	for i := range e.md5Keys {
+		k := &e.md5Keys[i]
+		if k.prefixLen > prefixLen && k.matches(addr) {
+			key = k.key
+			prefixLen = k.prefixLen
+		}
+	}
+	return key
+}
+
+// copyMD5KeysTo copies e's keys to n, which must not have any keys.
+func (e *endpoint) copyMD5KeysTo(n *endpoint) {
+	e.md5Mu.Lock()
+	keys := append([]md5Key(nil), e.md5Keys...)
+	e.md5Mu.Unlock()
+
+	n.md5Mu.Lock()
+	n.md5Keys = keys
+	n.md5Mu.Unlock()
+}
+
+// md5Digest returns the RFC 2385 digest of the segment with the given TCP
+// header and payload, sent from src to dst, computed with key.
+func md5Digest(key []byte, src, dst tcpip.Address, tcp header.TCP, data stack.PacketData) []byte {
+	h := md5.New()
+
+	// The pseudo-header is that used for checksums, except that the IPv6
+	// layout is used for IPv6.
+	length := len(tcp) + data.Size()
+	h.Write([]byte(src))
+	h.Write([]byte(dst))
+	if len(src) == header.IPv4AddressSize {
+		var b [4]byte
+		b[1] = uint8(header.TCPProtocolNumber)
+		binary.BigEndian.PutUint16(b[2:], uint16(length))
+		h.Write(b[:])
+	} else {
+		var b [8]byte
+		binary.BigEndian.PutUint32(b[:], uint32(length))
+		b[7] = uint8(header.TCPProtocolNumber)
+		h.Write(b[:])
+	}
+
+	// The TCP header excludes options and has a zero checksum.
+	var hdr [header.TCPMinimumSize]byte
+	copy(hdr[:], tcp)
+	header.TCP(hdr[:]).SetChecksum(0)
+	h.Write(hdr[:])
+
+	data.ReadTo(h, true /* peek */)
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// md5Valid returns false if s must be dropped because its MD5 signature is
+// missing, unexpected or incorrect.
+func (e *endpoint) md5Valid(s *segment) bool {
+	key := e.md5KeyFor(s.id.RemoteAddress)
+	digest, ok := header.ParseMD5SigOption(s.options)
+	if key == nil {
+		// As in Linux, segments signed for an unknown key are dropped.
+		return !ok
+	}
+	if !ok {
+		return false
+	}
+	net := s.pkt.Network()
+	want := md5Digest(key, net.SourceAddress(), net.DestinationAddress(), header.TCP(s.pkt.TransportHeader().Slice()), s.pkt.Data())
+	return subtle.ConstantTimeCompare(digest, want) == 1
+}
+
+// encodeMD5Placeholder encodes an MD5 signature option with a zero digest,
+// preceded by two NOPs, into b. The digest is filled in by buildTCPHdr once
+// the rest of the segment is known. It returns the number of bytes written.
+func encodeMD5Placeholder(b []byte) int {
+	var zero [header.TCPMD5DigestSize]byte
+	offset := header.EncodeNOP(b)
+	offset += header.EncodeNOP(b[offset:])
+	offset += header.EncodeMD5SigOption(zero[:], b[offset:])
+	return offset
+}
+
+// signTCPHdr fills in the digest of the MD5 signature option encoded by
+// encodeMD5Placeholder at the start of tcp's options.
+func signTCPHdr(r *stack.Route, key []byte, tcp header.TCP, data stack.PacketData) {
+	digest := md5Digest(key, r.LocalAddress(), r.RemoteAddress(), tcp, data)
+	copy(tcp[header.TCPMinimumSize+md5OptionSize-header.TCPMD5DigestSize:], digest)
+}
@@ -104,8 +104,17 @@ type protocol struct {
 	maxRTO                     time.Duration
 	maxRetries                 uint32
 	synRetries                 uint8
+	fastOpen                   tcpip.TCPFastOpenOption
 	dispatcher                 dispatcher
 
+	// fastOpenKeys are the keys used to generate and validate TCP Fast Open
+	// cookies for passive opens.
+	fastOpenKeys fastOpenKeys
+
+	// fastOpenCookies caches the TCP Fast Open cookies received from peers
+	// for active opens.
+	fastOpenCookies fastOpenCookieCache
+
 	// The following secrets are initialized once and stay unchanged after.
 	seqnumSecret     uint32
 	portOffsetSecret uint32
@@ -371,6 +380,15 @@ func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) tcpip
 		p.mu.Unlock()
 		return nil
 
+	case *tcpip.TCPFastOpenOption:
+		if *v&^(tcpip.TCPFastOpenClient|tcpip.TCPFastOpenServer) != 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		p.mu.Lock()
+		p.fastOpen = *v
+		p.mu.Unlock()
+		return nil
+
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
 	}
@@ -475,6 +493,12 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) tcpip.Er
 		p.mu.RUnlock()
 		return nil
 
+	case *tcpip.TCPFastOpenOption:
+		p.mu.RLock()
+		*v = p.fastOpen
+		p.mu.RUnlock()
+		return nil
+
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
 	}
@@ -525,6 +549,7 @@ func NewProtocol(s *stack.Stack) stack.TransportProtocol {
 		timeWaitTimeout:            DefaultTCPTimeWaitTimeout,
 		timeWaitReuse:              tcpip.TCPTimeWaitReuseLoopbackOnly,
 		synRetries:                 DefaultSynRetries,
+		fastOpen:                   tcpip.TCPFastOpenClient | tcpip.TCPFastOpenServer,
 		minRTO:                     MinRTO,
 		maxRTO:                     MaxRTO,
 		maxRetries:                 MaxRetries,
@@ -533,6 +558,7 @@ func NewProtocol(s *stack.Stack) stack.TransportProtocol {
 		portOffsetSecret:           s.Rand().Uint32(),
 		tsOffsetSecret:             s.Rand().Uint32(),
 	}
+	p.fastOpenKeys.init(s)
 	p.dispatcher.init(s.Rand(), runtime.GOMAXPROCS(0))
 	return &p
 }
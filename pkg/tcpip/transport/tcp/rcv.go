@@ -50,6 +50,10 @@ type receiver struct {
 
 	// Time when the last ack was received.
 	lastRcvdAckTime tcpip.MonotonicTime
+
+	// bytesReceived is the number of payload bytes received in sequence.
+	// It is analogous to Linux's tcp_sock.bytes_received.
+	bytesReceived uint64
 }
 
 func newReceiver(ep *endpoint, irs seqnum.Value, rcvWnd seqnum.Size, rcvWndScale uint8) *receiver {
@@ -218,6 +222,7 @@ func (r *receiver) consumeSegment(s *segment, segSeq seqnum.Value, segLen seqnum
 			s.sequenceNumber.UpdateForward(diff)
 			s.TrimFront(diff)
 		}
+		r.bytesReceived += uint64(s.payloadSize())
 
 		// Move segment to ready-to-deliver list. Wakeup any waiters.
 		r.ep.readyToRead(s)
@@ -44,6 +44,10 @@ func (sr *sackRecovery) handleSACKRecovery(limit int, end seqnum.Value) (dataSen
 
 	nextSegHint := snd.writeList.Front()
 	for snd.Outstanding < snd.SndCwnd {
+		// Retransmissions during recovery are paced like new data.
+		if snd.paced() {
+			return dataSent
+		}
 		var nextSeg *segment
 		var rescueRtx bool
 		nextSeg, nextSegHint, rescueRtx = snd.NextSeg(nextSegHint)
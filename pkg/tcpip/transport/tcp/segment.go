@@ -90,6 +90,12 @@ type segment struct {
 
 	// lost indicates if the segment is marked as lost by RACK.
 	lost bool
+
+	// txTimestamp is true if the SO_TIMESTAMPING transmit timestamp of the
+	// segment, identified by txTimestampKey, must be reported when it is
+	// first sent. It is only set for outgoing segments that end a write.
+	txTimestamp    bool
+	txTimestampKey uint32
 }
 
 func newIncomingSegment(id stack.TransportEndpointID, clock tcpip.Clock, pkt stack.PacketBufferPtr) (*segment, error) {
@@ -147,6 +153,8 @@ func (s *segment) clone() *segment {
 	t.ep = s.ep
 	t.qFlags = s.qFlags
 	t.dataMemSize = s.dataMemSize
+	t.txTimestamp = s.txTimestamp
+	t.txTimestampKey = s.txTimestampKey
 	t.pkt = s.pkt.Clone()
 	return t
 }
@@ -163,6 +171,12 @@ func (s *segment) merge(oth *segment) {
 	s.pkt.Data().Merge(oth.pkt.Data())
 	s.dataMemSize = s.pkt.MemSize()
 	oth.dataMemSize = oth.pkt.MemSize()
+	// As in Linux, only the timestamp of the last write in the merged
+	// segment is reported.
+	if oth.txTimestamp {
+		s.txTimestamp = true
+		s.txTimestampKey = oth.txTimestampKey
+	}
 }
 
 // setOwner sets the owning endpoint for this segment. Its required
@@ -45,6 +45,11 @@ const (
 	// before timing out the connection.
 	// Linux default TCP_RETR2, net.ipv4.tcp_retries2.
 	MaxRetries = 15
+
+	// unpacedSegments is the number of data segments sent before pacing
+	// starts, so that the initial window isn't delayed. Linux hardcodes
+	// the same value in net/ipv4/tcp_output.c:tcp_update_skb_after_send().
+	unpacedSegments = 10
 )
 
 // congestionControl is an interface that must be implemented by any supported
@@ -148,6 +153,53 @@ type sender struct {
 	// segment after entering an RTO for the first time as described in
 	// RFC3522 Section 3.2.
 	retransmitTS uint32
+
+	// rtoRetransmits is the number of consecutive retransmit timeouts
+	// without the peer acknowledging new data. It is analogous to Linux's
+	// inet_connection_sock.icsk_retransmits.
+	rtoRetransmits uint32
+
+	// totalRetransmits is the number of segments retransmitted since the
+	// start of the connection.
+	totalRetransmits uint32
+
+	// bytesSent is the number of payload bytes sent, including
+	// retransmissions.
+	bytesSent uint64
+
+	// bytesRetransmitted is the number of payload bytes retransmitted.
+	bytesRetransmitted uint64
+
+	// bytesAcked is the number of sequence numbers cumulatively
+	// acknowledged by the peer. It is analogous to Linux's
+	// tcp_sock.bytes_acked.
+	bytesAcked uint64
+
+	// minRTT is the minimum round-trip time sampled on the connection.
+	minRTT time.Duration
+
+	// deliveryRate is the most recent sample of the rate at which data was
+	// acknowledged by the peer, in bytes per second.
+	deliveryRate uint64
+
+	// rateSampleStart is the time at which the current delivery rate
+	// sample started, and rateSampleBytes is the number of bytes
+	// acknowledged since then.
+	rateSampleStart tcpip.MonotonicTime
+	rateSampleBytes uint64
+
+	// pacingTimer is used to resume transmission at pacingNext when the
+	// sender is paced.
+	pacingTimer timer `state:"nosave"`
+
+	// pacingNext is the earliest time at which the next data segment may be
+	// sent when the sender is paced.
+	pacingNext tcpip.MonotonicTime `state:"nosave"`
+
+	// dataSegmentsSent is the number of segments with payload sent,
+	// including retransmissions. It is analogous to Linux's
+	// tcp_sock.data_segs_out.
+	dataSegmentsSent uint64
 }
 
 // rtt is a synchronization wrapper used to appease stateify. See the comment
@@ -192,6 +244,8 @@ func newSender(ep *endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 		s.ep.gso.MSS = uint16(maxPayloadSize)
 	}
 
+	s.rateSampleStart = s.LastSendTime
+
 	s.cc = s.initCongestionControl(ep.cc)
 	s.lr = s.initLossRecovery()
 	s.rc.init(s, iss)
@@ -205,6 +259,7 @@ func newSender(ep *endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 	s.resendTimer.init(s.ep.stack.Clock(), maybeFailTimerHandler(s.ep, s.retransmitTimerExpired))
 	s.reorderTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.rc.reorderTimerExpired))
 	s.probeTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.probeTimerExpired))
+	s.pacingTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.pacingTimerExpired))
 
 	s.ep.AssertLockHeld(ep)
 	s.updateMaxPayloadSize(int(ep.route.MTU()), 0)
@@ -226,11 +281,7 @@ func newSender(ep *endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 	}
 	s.maxRTO = time.Duration(maxRTO)
 
-	var maxRetries tcpip.TCPMaxRetriesOption
-	if err := ep.stack.TransportProtocolOption(ProtocolNumber, &maxRetries); err != nil {
-		panic(fmt.Sprintf("unable to get maxRetries from stack: %s", err))
-	}
-	s.maxRetries = uint32(maxRetries)
+	s.maxRetries = ep.maxRetries
 
 	return s
 }
@@ -341,6 +392,10 @@ func (s *sender) sendAck() {
 // updateRTO updates the retransmit timeout when a new roud-trip time is
 // available. This is done in accordance with section 2 of RFC 6298.
 func (s *sender) updateRTO(rtt time.Duration) {
+	if s.minRTT == 0 || rtt < s.minRTT {
+		s.minRTT = rtt
+	}
+
 	s.rtt.Lock()
 	if !s.rtt.TCPRTTState.SRTTInited {
 		s.rtt.TCPRTTState.RTTVar = rtt / 2
@@ -394,6 +449,127 @@ func (s *sender) updateRTO(rtt time.Duration) {
 	}
 }
 
+// updateDeliveryRate accounts for acked newly acknowledged bytes in the
+// delivery rate estimate. Samples are taken over intervals of at least one
+// smoothed round-trip time, which is a simplification of Linux's
+// net/ipv4/tcp_rate.c:tcp_rate_gen().
+func (s *sender) updateDeliveryRate(acked seqnum.Size) {
+	now := s.ep.stack.Clock().NowMonotonic()
+	s.rateSampleBytes += uint64(acked)
+	interval := now.Sub(s.rateSampleStart)
+	s.rtt.Lock()
+	srtt := s.rtt.TCPRTTState.SRTT
+	s.rtt.Unlock()
+	if interval <= 0 || interval < srtt {
+		return
+	}
+	s.deliveryRate = s.rateSampleBytes * uint64(time.Second) / uint64(interval)
+	s.rateSampleStart = now
+	s.rateSampleBytes = 0
+}
+
+// pacingRate returns the rate at which Linux would pace the connection, in
+// bytes per second, as computed by
+// net/ipv4/tcp_input.c:tcp_update_pacing_rate(). It doesn't account for
+// SO_MAX_PACING_RATE; see currentPacingRate.
+func (s *sender) pacingRate(srtt time.Duration) uint64 {
+	if srtt <= 0 {
+		return 0
+	}
+	rate := uint64(s.MaxPayloadSize) * uint64(s.SndCwnd) * uint64(time.Second) / uint64(srtt)
+	// Pace at 200% of the current rate during slow start, and at 120%
+	// otherwise.
+	if s.SndCwnd < s.Ssthresh/2 {
+		return rate * 2
+	}
+	return rate * 6 / 5
+}
+
+// currentPacingRate returns the rate at which data segments are paced, in
+// bytes per second, or 0 if they aren't paced.
+//
+// Like Linux without the fq qdisc or BBR, segments are only paced once
+// SO_MAX_PACING_RATE is set. The rate is then the lower of SO_MAX_PACING_RATE
+// and pacingRate, which falls back to the delivery rate estimate until the
+// RTT has been sampled.
+func (s *sender) currentPacingRate() uint64 {
+	maxRate := s.ep.ops.GetMaxPacingRate()
+	if maxRate == math.MaxUint64 {
+		return 0
+	}
+	s.rtt.Lock()
+	srtt := s.rtt.TCPRTTState.SRTT
+	s.rtt.Unlock()
+	rate := s.pacingRate(srtt)
+	if rate == 0 {
+		rate = s.deliveryRate
+	}
+	if rate == 0 || rate > maxRate {
+		rate = maxRate
+	}
+	return rate
+}
+
+// updatePacing accounts for the transmission of a data segment with size
+// bytes of payload in the pacing schedule. Idle time isn't credited, so the
+// sender never bursts to catch up.
+// +checklocks:s.ep.mu
+func (s *sender) updatePacing(size int) {
+	s.dataSegmentsSent++
+	if s.dataSegmentsSent <= unpacedSegments {
+		return
+	}
+	rate := s.currentPacingRate()
+	if rate == 0 {
+		return
+	}
+	if now := s.ep.stack.Clock().NowMonotonic(); s.pacingNext.Before(now) {
+		s.pacingNext = now
+	}
+	s.pacingNext = s.pacingNext.Add(time.Duration(uint64(size) * uint64(time.Second) / rate))
+}
+
+// paced returns true if the transmission of the next data segment must be
+// deferred to respect the pacing rate. If so, the pacing timer is enabled to
+// resume transmission. This is analogous to Linux's
+// net/ipv4/tcp_output.c:tcp_pacing_check().
+// +checklocks:s.ep.mu
+func (s *sender) paced() bool {
+	if s.currentPacingRate() == 0 {
+		return false
+	}
+	d := s.pacingNext.Sub(s.ep.stack.Clock().NowMonotonic())
+	if d <= 0 {
+		return false
+	}
+	if !s.pacingTimer.enabled() {
+		s.pacingTimer.enable(d)
+	}
+	return true
+}
+
+// pacingTimerExpired resumes the transmissions deferred by paced.
+// +checklocks:s.ep.mu
+func (s *sender) pacingTimerExpired() {
+	if s.pacingTimer.isZero() || !s.pacingTimer.checkExpiration() {
+		return
+	}
+
+	// Resume transmission like handleRcvdSegment does.
+	if s.FastRecovery.Active {
+		if s.ep.tcpRecovery&tcpip.TCPRACKLossDetection != 0 {
+			s.rc.DoRecovery(nil, false /* fastRetransmit */)
+		} else if sr, ok := s.lr.(*sackRecovery); ok {
+			// When SACK is enabled data sending is governed by the RFC
+			// 6675 recovery steps.
+			dataSent := sr.handleSACKRecovery(s.MaxPayloadSize, s.SndUna.Add(s.SndWnd))
+			s.postXmit(dataSent, true /* shouldScheduleProbe */)
+			return
+		}
+	}
+	s.sendData()
+}
+
 // resendSegment resends the first unacknowledged segment.
 // +checklocks:s.ep.mu
 func (s *sender) resendSegment() {
@@ -484,6 +660,8 @@ func (s *sender) retransmitTimerExpired() tcpip.Error {
 		return &tcpip.ErrTimeout{}
 	}
 
+	s.rtoRetransmits++
+
 	// Set new timeout. The timer will be restarted by the call to sendData
 	// below.
 	s.RTO *= 2
@@ -557,8 +735,10 @@ func (s *sender) retransmitTimerExpired() tcpip.Error {
 
 	seg := s.writeNext
 	// RFC 1122 4.2.3.5: Close the connection when the number of
-	// retransmissions for this segment is beyond a limit.
-	if seg != nil && seg.xmitCount > s.maxRetries {
+	// retransmissions for this segment is beyond a limit. A user timeout
+	// replaces this limit, as in Linux's
+	// net/ipv4/tcp_timer.c:retransmits_timed_out().
+	if seg != nil && uto == 0 && seg.xmitCount > s.maxRetries {
 		s.ep.stack.Stats().TCP.EstablishedTimedout.Increment()
 		return &tcpip.ErrTimeout{}
 	}
@@ -585,8 +765,10 @@ func (s *sender) splitSeg(seg *segment, size int) {
 	if seg.payloadSize() <= size {
 		return
 	}
-	// Split this segment up.
+	// Split this segment up. The transmit timestamp, if any, is for the end
+	// of the segment.
 	nSeg := seg.clone()
+	seg.txTimestamp = false
 	nSeg.pkt.Data().TrimFront(size)
 	nSeg.sequenceNumber.UpdateForward(seqnum.Size(size))
 	s.writeList.InsertAfter(seg, nSeg)
@@ -971,6 +1153,9 @@ func (s *sender) sendData() {
 			s.updateWriteNext(seg.Next())
 			continue
 		}
+		if seg.payloadSize() != 0 && s.paced() {
+			break
+		}
 		if sent := s.maybeSendSegment(seg, limit, end); !sent {
 			break
 		}
@@ -1492,6 +1677,9 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 		// Remove all acknowledged data from the write list.
 		acked := s.SndUna.Size(ack)
 		s.SndUna = ack
+		s.rtoRetransmits = 0
+		s.bytesAcked += uint64(acked)
+		s.updateDeliveryRate(acked)
 		ackLeft := acked
 		originalOutstanding := s.Outstanding
 		for ackLeft > 0 {
@@ -1632,12 +1820,25 @@ func (s *sender) sendSegment(seg *segment) tcpip.Error {
 		if s.SndCwnd < s.Ssthresh {
 			s.ep.stack.Stats().TCP.SlowStartRetransmits.Increment()
 		}
+		s.totalRetransmits++
+		s.bytesRetransmitted += uint64(seg.payloadSize())
+	}
+	s.bytesSent += uint64(seg.payloadSize())
+	if seg.payloadSize() != 0 {
+		// Retransmissions are accounted for in the pacing schedule even
+		// when they aren't deferred by it, as after RTO expiration.
+		s.updatePacing(seg.payloadSize())
+	}
+	// Only the first transmission of a segment is timestamped.
+	var txTimestamp func(stack.PacketBufferPtr)
+	if seg.txTimestamp && seg.xmitCount == 0 {
+		txTimestamp = stack.NewTXTimestamp(s.ep.stack.Clock(), &s.ep.ops, seg.txTimestampKey, s.ep.waiterQueue)
 	}
 	seg.xmitTime = s.ep.stack.Clock().NowMonotonic()
 	seg.xmitCount++
 	seg.lost = false
 
-	err := s.sendSegmentFromPacketBuffer(seg.pkt, seg.flags, seg.sequenceNumber)
+	err := s.sendSegmentFromPacketBuffer(seg.pkt, seg.flags, seg.sequenceNumber, txTimestamp)
 
 	// Every time a packet containing data is sent (including a
 	// retransmission), if SACK is enabled and we are retransmitting data
@@ -1657,10 +1858,11 @@ func (s *sender) sendSegment(seg *segment) tcpip.Error {
 }
 
 // sendSegmentFromPacketBuffer sends a new segment containing the given payload,
-// flags and sequence number.
+// flags and sequence number. txTimestamp, if not nil, is set as the
+// PacketBuffer.TXTimestamp of the sent packet.
 // +checklocks:s.ep.mu
 // +checklocksalias:s.ep.rcv.ep.mu=s.ep.mu
-func (s *sender) sendSegmentFromPacketBuffer(pkt stack.PacketBufferPtr, flags header.TCPFlags, seq seqnum.Value) tcpip.Error {
+func (s *sender) sendSegmentFromPacketBuffer(pkt stack.PacketBufferPtr, flags header.TCPFlags, seq seqnum.Value, txTimestamp func(stack.PacketBufferPtr)) tcpip.Error {
 	s.LastSendTime = s.ep.stack.Clock().NowMonotonic()
 	if seq == s.RTTMeasureSeqNum {
 		s.RTTMeasureTime = s.LastSendTime
@@ -1675,6 +1877,7 @@ func (s *sender) sendSegmentFromPacketBuffer(pkt stack.PacketBufferPtr, flags he
 	// and pkt could be reprocessed later on (i.e retrasmission).
 	pkt = pkt.Clone()
 	defer pkt.DecRef()
+	pkt.TXTimestamp = txTimestamp
 
 	return s.ep.sendRaw(pkt, flags, seq, rcvNxt, rcvWnd)
 }
@@ -0,0 +1,320 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_fastopen_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/refsvfs2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checker"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/test/e2e"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/testing/context"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// fastOpenOptions returns TCP options holding a Fast Open option with cookie,
+// which is a cookie request if empty.
+func fastOpenOptions(cookie []byte) []byte {
+	opts := make([]byte, (header.TCPOptionFastOpenMinLength+len(cookie)+3)&^3)
+	offset := header.EncodeFastOpenOption(cookie, opts)
+	header.AddTCPOptionPadding(opts, offset)
+	return opts
+}
+
+// listen creates an endpoint listening on context.StackPort with TCP Fast Open
+// enabled.
+func listen(t *testing.T, c *context.Context) {
+	t.Helper()
+
+	var err tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+	if err := c.EP.SetSockOptInt(tcpip.TCPFastOpenQueueLenOption, 5); err != nil {
+		t.Fatalf("SetSockOptInt(TCPFastOpenQueueLenOption, 5): %s", err)
+	}
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %s", err)
+	}
+	if err := c.EP.Listen(10); err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+}
+
+// sendSYN sends a SYN from port with the given TCP options and payload, and
+// returns the SYN-ACK received in response, along with its options.
+func sendSYN(t *testing.T, c *context.Context, port uint16, irs seqnum.Value, opts, payload []byte) (header.TCP, header.TCPSynOptions) {
+	t.Helper()
+
+	c.SendPacket(payload, &context.Headers{
+		SrcPort: port,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagSyn,
+		SeqNum:  irs,
+		RcvWnd:  30000,
+		TCPOpts: opts,
+	})
+	v := c.GetPacket()
+	defer v.Release()
+	checker.IPv4(t, v, checker.TCP(
+		checker.SrcPort(context.StackPort),
+		checker.DstPort(port),
+		checker.TCPFlags(header.TCPFlagAck|header.TCPFlagSyn),
+	))
+	tcpHdr := header.TCP(append([]byte(nil), header.IPv4(v.AsSlice()).Payload()...))
+	return tcpHdr, header.ParseSynOptions(tcpHdr.Options(), true /* isAck */)
+}
+
+// getCookie requests a cookie from the listening endpoint.
+func getCookie(t *testing.T, c *context.Context) []byte {
+	t.Helper()
+
+	irs := seqnum.Value(context.TestInitialSequenceNumber)
+	tcpHdr, synOpts := sendSYN(t, c, context.TestPort, irs, fastOpenOptions(nil), nil)
+	if !synOpts.FastOpen || len(synOpts.FastOpenCookie) == 0 {
+		t.Fatalf("SYN-ACK has no Fast Open cookie: %+v", synOpts)
+	}
+	// Abort the connection.
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagRst,
+		SeqNum:  irs + 1,
+		AckNum:  seqnum.Value(tcpHdr.SequenceNumber()) + 1,
+	})
+	return synOpts.FastOpenCookie
+}
+
+func TestFastOpenCookieRequest(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	listen(t, c)
+	irs := seqnum.Value(context.TestInitialSequenceNumber)
+	tcpHdr, synOpts := sendSYN(t, c, context.TestPort, irs, fastOpenOptions(nil), []byte{1, 2, 3})
+	if !synOpts.FastOpen || len(synOpts.FastOpenCookie) == 0 {
+		t.Errorf("SYN-ACK has no Fast Open cookie: %+v", synOpts)
+	}
+	// The data in a SYN without a cookie must not be accepted.
+	if got, want := seqnum.Value(tcpHdr.AckNumber()), irs+1; got != want {
+		t.Errorf("got SYN-ACK ack = %d, want = %d", got, want)
+	}
+	if got := c.Stack().Stats().TCP.FastOpenCookieReqd.Value(); got != 1 {
+		t.Errorf("got stats.TCP.FastOpenCookieReqd.Value() = %d, want = 1", got)
+	}
+	if _, _, err := c.EP.Accept(nil); err == nil {
+		t.Errorf("Accept succeeded before the handshake completed")
+	}
+}
+
+func TestFastOpenDisabled(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	listen(t, c)
+	if err := c.EP.SetSockOptInt(tcpip.TCPFastOpenQueueLenOption, 0); err != nil {
+		t.Fatalf("SetSockOptInt(TCPFastOpenQueueLenOption, 0): %s", err)
+	}
+	_, synOpts := sendSYN(t, c, context.TestPort, context.TestInitialSequenceNumber, fastOpenOptions(nil), nil)
+	if synOpts.FastOpen {
+		t.Errorf("SYN-ACK has a Fast Open option: %+v", synOpts)
+	}
+}
+
+func TestFastOpenPassiveData(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	listen(t, c)
+	cookie := getCookie(t, c)
+
+	we, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	c.WQ.EventRegister(&we)
+	defer c.WQ.EventUnregister(&we)
+
+	data := []byte{1, 2, 3}
+	irs := seqnum.Value(context.TestInitialSequenceNumber + 1000)
+	tcpHdr, _ := sendSYN(t, c, context.TestPort+1, irs, fastOpenOptions(cookie), data)
+	if got, want := seqnum.Value(tcpHdr.AckNumber()), irs.Add(seqnum.Size(1+len(data))); got != want {
+		t.Errorf("got SYN-ACK ack = %d, want = %d", got, want)
+	}
+	if got := c.Stack().Stats().TCP.FastOpenPassive.Value(); got != 1 {
+		t.Errorf("got stats.TCP.FastOpenPassive.Value() = %d, want = 1", got)
+	}
+
+	// The endpoint must be accepted before the handshake completes.
+	select {
+	case <-ch:
+	case <-time.After(1 * time.Second):
+		t.Fatalf("Timed out waiting for the connection to be accepted")
+	}
+	ep, _, err := c.EP.Accept(nil)
+	if err != nil {
+		t.Fatalf("Accept failed: %s", err)
+	}
+	defer ep.Close()
+
+	var buf bytes.Buffer
+	if _, err := ep.Read(&buf, tcpip.ReadOptions{}); err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("got data = %v, want = %v", buf.Bytes(), data)
+	}
+
+	// Complete the handshake.
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort + 1,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  irs.Add(seqnum.Size(1 + len(data))),
+		AckNum:  seqnum.Value(tcpHdr.SequenceNumber()) + 1,
+		RcvWnd:  30000,
+	})
+	// The endpoint must not be delivered to the accept queue again.
+	c.CheckNoPacketTimeout("got a packet in response to the final ACK", 100*time.Millisecond)
+	if _, _, err := c.EP.Accept(nil); err == nil {
+		t.Errorf("Accept succeeded twice for the same connection")
+	}
+}
+
+func TestFastOpenInvalidCookie(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	listen(t, c)
+	irs := seqnum.Value(context.TestInitialSequenceNumber)
+	bad := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	tcpHdr, synOpts := sendSYN(t, c, context.TestPort, irs, fastOpenOptions(bad), []byte{1, 2, 3})
+	if got, want := seqnum.Value(tcpHdr.AckNumber()), irs+1; got != want {
+		t.Errorf("got SYN-ACK ack = %d, want = %d", got, want)
+	}
+	// A new cookie is given to the peer.
+	if !synOpts.FastOpen || len(synOpts.FastOpenCookie) == 0 || bytes.Equal(synOpts.FastOpenCookie, bad) {
+		t.Errorf("SYN-ACK has no new Fast Open cookie: %+v", synOpts)
+	}
+	if got := c.Stack().Stats().TCP.FastOpenPassiveFail.Value(); got != 1 {
+		t.Errorf("got stats.TCP.FastOpenPassiveFail.Value() = %d, want = 1", got)
+	}
+	if _, _, err := c.EP.Accept(nil); err == nil {
+		t.Errorf("Accept succeeded before the handshake completed")
+	}
+}
+
+func TestFastOpenActive(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	addr := tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}
+	data := []byte{1, 2, 3}
+	cookie := []byte{8, 7, 6, 5, 4, 3, 2, 1}
+
+	// Without a cookie, the SYN carries a cookie request and no data.
+	c.Create(-1 /* epRcvBuf */)
+	_, err := c.EP.Write(bytes.NewReader(data), tcpip.WriteOptions{To: &addr, FastOpen: true})
+	if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
+		t.Fatalf("got Write(...) = %v, want = %s", err, &tcpip.ErrConnectStarted{})
+	}
+	v := c.GetPacket()
+	tcpHdr := header.TCP(header.IPv4(v.AsSlice()).Payload())
+	if got := len(tcpHdr.Payload()); got != 0 {
+		t.Errorf("got SYN payload length = %d, want = 0", got)
+	}
+	synOpts := header.ParseSynOptions(tcpHdr.Options(), false /* isAck */)
+	if !synOpts.FastOpen || len(synOpts.FastOpenCookie) != 0 {
+		t.Errorf("SYN has no Fast Open cookie request: %+v", synOpts)
+	}
+	iss := seqnum.Value(tcpHdr.SequenceNumber())
+	srcPort := tcpHdr.SourcePort()
+	v.Release()
+
+	// Give the endpoint a cookie in the SYN-ACK.
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: srcPort,
+		Flags:   header.TCPFlagSyn | header.TCPFlagAck,
+		SeqNum:  context.TestInitialSequenceNumber,
+		AckNum:  iss + 1,
+		RcvWnd:  30000,
+		TCPOpts: fastOpenOptions(cookie),
+	})
+	v = c.GetPacket()
+	checker.IPv4(t, v, checker.TCP(checker.TCPFlags(header.TCPFlagAck)))
+	v.Release()
+
+	// The next connection sends its data in the SYN, with the cookie.
+	var wq waiter.Queue
+	ep, err := c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+	defer ep.Close()
+	n, err := ep.Write(bytes.NewReader(data), tcpip.WriteOptions{To: &addr, FastOpen: true})
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("got Write(...) = (%d, %v), want = (%d, nil)", n, err, len(data))
+	}
+	v = c.GetPacket()
+	defer v.Release()
+	tcpHdr = header.TCP(header.IPv4(v.AsSlice()).Payload())
+	checker.IPv4(t, v, checker.TCP(checker.TCPFlags(header.TCPFlagSyn)))
+	if !bytes.Equal(tcpHdr.Payload(), data) {
+		t.Errorf("got SYN payload = %v, want = %v", tcpHdr.Payload(), data)
+	}
+	synOpts = header.ParseSynOptions(tcpHdr.Options(), false /* isAck */)
+	if !synOpts.FastOpen || !bytes.Equal(synOpts.FastOpenCookie, cookie) {
+		t.Errorf("got SYN options = %+v, want Fast Open cookie %v", synOpts, cookie)
+	}
+	if got := c.Stack().Stats().TCP.FastOpenActive.Value(); got != 1 {
+		t.Errorf("got stats.TCP.FastOpenActive.Value() = %d, want = 1", got)
+	}
+}
+
+func TestFastOpenSockOpts(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.Create(-1 /* epRcvBuf */)
+	for _, opt := range []tcpip.SockOptInt{tcpip.TCPFastOpenQueueLenOption, tcpip.TCPFastOpenConnectOption} {
+		if err := c.EP.SetSockOptInt(opt, 1); err != nil {
+			t.Fatalf("SetSockOptInt(%d, 1): %s", opt, err)
+		}
+		if v, err := c.EP.GetSockOptInt(opt); err != nil || v != 1 {
+			t.Errorf("got GetSockOptInt(%d) = (%d, %v), want = (1, nil)", opt, v, err)
+		}
+	}
+	if err := c.EP.SetSockOptInt(tcpip.TCPFastOpenConnectOption, 2); err == nil {
+		t.Errorf("SetSockOptInt(TCPFastOpenConnectOption, 2) succeeded")
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	// Allow TCP async work to complete to avoid false reports of leaks.
+	// TODO(gvisor.dev/issue/5940): Use fake clock in tests.
+	time.Sleep(1 * time.Second)
+	refsvfs2.DoLeakCheck()
+	os.Exit(code)
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_md5_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/bufferv2"
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/refsvfs2"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checker"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/test/e2e"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/testing/context"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+var testKey = []byte("secret")
+
+// md5Options returns TCP options holding an MD5 signature option with a zero
+// digest, preceded by two NOPs.
+func md5Options() []byte {
+	opts := make([]byte, 2+header.TCPOptionMD5SigLength)
+	offset := header.EncodeNOP(opts)
+	offset += header.EncodeNOP(opts[offset:])
+	header.EncodeMD5SigOption(make([]byte, header.TCPMD5DigestSize), opts[offset:])
+	return opts
+}
+
+// digest returns the RFC 2385 digest of the TCP segment in the IPv4 packet b.
+func digest(b []byte, key []byte) []byte {
+	ip := header.IPv4(b)
+	tcpHdr := header.TCP(ip.Payload())
+
+	h := md5.New()
+	h.Write([]byte(ip.SourceAddress()))
+	h.Write([]byte(ip.DestinationAddress()))
+	var pseudo [4]byte
+	pseudo[1] = uint8(tcp.ProtocolNumber)
+	binary.BigEndian.PutUint16(pseudo[2:], uint16(len(tcpHdr)))
+	h.Write(pseudo[:])
+
+	var hdr [header.TCPMinimumSize]byte
+	copy(hdr[:], tcpHdr)
+	header.TCP(hdr[:]).SetChecksum(0)
+	h.Write(hdr[:])
+	h.Write(tcpHdr.Payload())
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// sendSigned sends a segment signed with key.
+func sendSigned(c *context.Context, payload []byte, h *context.Headers, key []byte) {
+	h.TCPOpts = md5Options()
+	buf := c.BuildSegment(payload, h)
+	b := buf.Flatten()
+	buf.Release()
+
+	ip := header.IPv4(b)
+	tcpHdr := header.TCP(ip.Payload())
+	copy(tcpHdr[header.TCPMinimumSize+2+2:], digest(b, key))
+	tcpHdr.SetChecksum(0)
+	xsum := header.PseudoHeaderChecksum(tcp.ProtocolNumber, ip.SourceAddress(), ip.DestinationAddress(), uint16(len(tcpHdr)))
+	xsum = checksum.Checksum(payload, xsum)
+	tcpHdr.SetChecksum(^tcpHdr.CalculateChecksum(xsum))
+	c.SendSegment(bufferv2.MakeWithData(b))
+}
+
+func TestMD5SignedReceive(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(context.TestInitialSequenceNumber, 30000, -1 /* epRcvBuf */)
+	opt := tcpip.TCPMD5SigOption{
+		Addr:      context.TestAddr,
+		PrefixLen: header.IPv4AddressSize * 8,
+		Key:       testKey,
+	}
+	if err := c.EP.SetSockOpt(&opt); err != nil {
+		t.Fatalf("SetSockOpt(&%#v): %s", opt, err)
+	}
+
+	we, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	c.WQ.EventRegister(&we)
+	defer c.WQ.EventUnregister(&we)
+
+	data := []byte{1, 2, 3}
+	iss := seqnum.Value(context.TestInitialSequenceNumber).Add(1)
+	headers := func() *context.Headers {
+		return &context.Headers{
+			SrcPort: context.TestPort,
+			DstPort: c.Port,
+			Flags:   header.TCPFlagAck,
+			SeqNum:  iss,
+			AckNum:  c.IRS.Add(1),
+			RcvWnd:  30000,
+		}
+	}
+
+	// Unsigned segments and segments signed with the wrong key must be
+	// dropped.
+	c.SendPacket(data, headers())
+	sendSigned(c, data, headers(), []byte("wrong"))
+	c.CheckNoPacketTimeout("got a packet in response to an unsigned segment", 100*time.Millisecond)
+	if got := c.Stack().Stats().TCP.ChecksumErrors.Value(); got != 0 {
+		t.Errorf("got stats.TCP.ChecksumErrors.Value() = %d, want = 0", got)
+	}
+
+	sendSigned(c, data, headers(), testKey)
+	select {
+	case <-ch:
+	case <-time.After(1 * time.Second):
+		t.Fatalf("Timed out waiting for data to arrive")
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.EP.Read(&buf, tcpip.ReadOptions{}); err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("got data = %v, want = %v", buf.Bytes(), data)
+	}
+
+	// The ACK must be signed.
+	v := c.GetPacket()
+	defer v.Release()
+	checker.IPv4(t, v,
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPSeqNum(uint32(c.IRS)+1),
+			checker.TCPAckNum(uint32(iss)+uint32(len(data))),
+			checker.TCPFlags(header.TCPFlagAck),
+		),
+	)
+	b := v.AsSlice()
+	got, ok := header.ParseMD5SigOption(header.TCP(header.IPv4(b).Payload()).Options())
+	if !ok {
+		t.Fatalf("ACK has no MD5 signature option")
+	}
+	if want := digest(b, testKey); !bytes.Equal(got, want) {
+		t.Errorf("got ACK digest = %x, want = %x", got, want)
+	}
+}
+
+func TestMD5DeleteKey(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.Create(-1 /* epRcvBuf */)
+	opt := tcpip.TCPMD5SigOption{
+		Addr:      context.TestAddr,
+		PrefixLen: header.IPv4AddressSize * 8,
+	}
+	if err := c.EP.SetSockOpt(&opt); err == nil {
+		t.Errorf("SetSockOpt(&%#v) succeeded for a key that doesn't exist", opt)
+	}
+
+	opt.Key = testKey
+	if err := c.EP.SetSockOpt(&opt); err != nil {
+		t.Fatalf("SetSockOpt(&%#v): %s", opt, err)
+	}
+	opt.Key = nil
+	if err := c.EP.SetSockOpt(&opt); err != nil {
+		t.Fatalf("SetSockOpt(&%#v): %s", opt, err)
+	}
+
+	opt.Key = make([]byte, 81)
+	if err := c.EP.SetSockOpt(&opt); err == nil {
+		t.Errorf("SetSockOpt succeeded with a %d byte key", len(opt.Key))
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	// Allow TCP async work to complete to avoid false reports of leaks.
+	// TODO(gvisor.dev/issue/5940): Use fake clock in tests.
+	time.Sleep(1 * time.Second)
+	refsvfs2.DoLeakCheck()
+	os.Exit(code)
+}
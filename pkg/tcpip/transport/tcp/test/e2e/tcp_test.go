@@ -1865,6 +1865,83 @@ func TestConnectBindToDevice(t *testing.T) {
 	}
 }
 
+func TestTCPConnectHook(t *testing.T) {
+	const redirectPort = context.TestPort + 1
+	for _, test := range []struct {
+		name     string
+		decision stack.TCPConnectDecision
+		wantErr  tcpip.Error
+		wantPort uint16
+	}{
+		{
+			name:     "Allow",
+			decision: stack.TCPConnectDecision{Verdict: stack.TCPConnectAllow},
+			wantErr:  &tcpip.ErrConnectStarted{},
+			wantPort: context.TestPort,
+		},
+		{
+			name:     "Deny",
+			decision: stack.TCPConnectDecision{Verdict: stack.TCPConnectDeny},
+			wantErr:  &tcpip.ErrConnectionRefused{},
+		},
+		{
+			name: "Redirect",
+			decision: stack.TCPConnectDecision{
+				Verdict:  stack.TCPConnectRedirect,
+				Redirect: tcpip.FullAddress{Addr: context.TestAddr, Port: redirectPort},
+			},
+			wantErr:  &tcpip.ErrConnectStarted{},
+			wantPort: redirectPort,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := context.New(t, e2e.DefaultMTU)
+			defer c.Cleanup()
+
+			var reqs []stack.TCPConnectRequest
+			c.Stack().SetTCPConnectHook(func(req stack.TCPConnectRequest) stack.TCPConnectDecision {
+				reqs = append(reqs, req)
+				return test.decision
+			})
+
+			c.Create(-1)
+			err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort})
+			if d := cmp.Diff(test.wantErr, err); d != "" {
+				t.Fatalf("c.EP.Connect(...) mismatch (-want +got):\n%s", d)
+			}
+
+			if len(reqs) != 1 {
+				t.Fatalf("got %d hook invocations, want 1", len(reqs))
+			}
+			want := stack.TransportEndpointID{
+				LocalAddress:  context.StackAddr,
+				RemotePort:    context.TestPort,
+				RemoteAddress: context.TestAddr,
+			}
+			if got := reqs[0].ID; got != want {
+				t.Errorf("got hook request ID = %+v, want = %+v", got, want)
+			}
+			if got, want := reqs[0].NetProto, ipv4.ProtocolNumber; got != want {
+				t.Errorf("got hook request NetProto = %d, want = %d", got, want)
+			}
+
+			if test.wantPort == 0 {
+				c.CheckNoPacket("got a SYN for a denied connection")
+				return
+			}
+			v := c.GetPacket()
+			defer v.Release()
+			checker.IPv4(t, v,
+				checker.DstAddr(context.TestAddr),
+				checker.TCP(
+					checker.DstPort(test.wantPort),
+					checker.TCPFlags(header.TCPFlagSyn),
+				),
+			)
+		})
+	}
+}
+
 func TestShutdownConnectingSocket(t *testing.T) {
 	for _, test := range []struct {
 		name         string
@@ -4131,6 +4208,72 @@ func TestMaxRetransmitsTimeout(t *testing.T) {
 	}
 }
 
+// TestMaxRetransmitsEndpointOption tests that the maximum number of
+// retransmits can be set per endpoint, and that a user timeout replaces it.
+func TestMaxRetransmitsEndpointOption(t *testing.T) {
+	const initRTO = time.Second
+	for _, test := range []struct {
+		name        string
+		userTimeout time.Duration
+		// transmits is the number of times the segment is sent before the
+		// connection times out.
+		transmits int
+	}{
+		{"NoUserTimeout", 0, 2},
+		// Retransmits at 1s and 3s, and times out at 3.5s.
+		{"UserTimeout", 3*initRTO + initRTO/2, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := context.New(t, e2e.DefaultMTU)
+			defer c.Cleanup()
+
+			minRTOOpt := tcpip.TCPMinRTOOption(initRTO)
+			if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &minRTOOpt); err != nil {
+				t.Fatalf("SetTransportProtocolOption(%d, &%T(%d)): %s", tcp.ProtocolNumber, minRTOOpt, minRTOOpt, err)
+			}
+			c.CreateConnected(context.TestInitialSequenceNumber, 30000 /* rcvWnd */, -1 /* epRcvBuf */)
+
+			opt := tcpip.TCPMaxRetriesOption(1)
+			if err := c.EP.SetSockOpt(&opt); err != nil {
+				t.Fatalf("c.EP.SetSockOpt(&%T(%d)): %s", opt, opt, err)
+			}
+			if test.userTimeout != 0 {
+				v := tcpip.TCPUserTimeoutOption(test.userTimeout)
+				if err := c.EP.SetSockOpt(&v); err != nil {
+					t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", v, test.userTimeout, err)
+				}
+			}
+
+			waitEntry, notifyCh := waiter.NewChannelEntry(waiter.EventHUp)
+			c.WQ.EventRegister(&waitEntry)
+			defer c.WQ.EventUnregister(&waitEntry)
+
+			var r bytes.Reader
+			r.Reset(make([]byte, 1))
+			if _, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil {
+				t.Fatalf("Write failed: %s", err)
+			}
+
+			for i := 0; i < test.transmits; i++ {
+				v := c.GetPacket()
+				defer v.Release()
+				checker.IPv4(t, v, checker.TCP(
+					checker.DstPort(context.TestPort),
+					checker.TCPFlags(header.TCPFlagAck|header.TCPFlagPsh),
+				))
+			}
+			select {
+			case <-notifyCh:
+			case <-time.After(4 * initRTO):
+				t.Fatalf("connection still alive after %s", 4*initRTO)
+			}
+			c.CheckNoPacket("unexpected retransmit after the connection timed out")
+			ept := endpointTester{c.EP}
+			ept.CheckReadError(t, &tcpip.ErrTimeout{})
+		})
+	}
+}
+
 // TestMaxRTO tests if the retransmit interval caps to MaxRTO.
 func TestMaxRTO(t *testing.T) {
 	c := context.New(t, e2e.DefaultMTU)
@@ -4273,6 +4416,174 @@ func TestRetransmitIPv4IDUniqueness(t *testing.T) {
 	}
 }
 
+func TestTCPInfoAfterRetransmit(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(context.TestInitialSequenceNumber, 30000 /* rcvWnd */, -1 /* epRcvBuf */)
+
+	const dataLen = 1000
+	var r bytes.Reader
+	r.Reset(make([]byte, dataLen))
+	if _, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+
+	// Drop the first transmission and wait for the retransmission.
+	for i := 0; i < 2; i++ {
+		v := c.GetPacket()
+		checker.IPv4(t, v,
+			checker.PayloadLen(dataLen+header.TCPMinimumSize),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(c.IRS)+1),
+			),
+		)
+		v.Release()
+	}
+
+	stats := c.EP.Stats().(*tcp.Stats)
+	getInfo := func() tcpip.TCPInfoOption {
+		var info tcpip.TCPInfoOption
+		if err := c.EP.GetSockOpt(&info); err != nil {
+			t.Fatalf("c.EP.GetSockOpt(&%T) = %s", info, err)
+		}
+		return info
+	}
+
+	info := getInfo()
+	if got, want := info.Retransmits, uint32(1); got != want {
+		t.Errorf("got info.Retransmits = %d, want = %d", got, want)
+	}
+	if got, want := uint64(info.TotalRetransmits), stats.SendErrors.Retransmits.Value(); got != want || got != 1 {
+		t.Errorf("got info.TotalRetransmits = %d, want = %d (and 1)", got, want)
+	}
+	if got, want := info.BytesSent, uint64(2*dataLen); got != want {
+		t.Errorf("got info.BytesSent = %d, want = %d", got, want)
+	}
+	if got, want := info.BytesRetransmitted, uint64(dataLen); got != want {
+		t.Errorf("got info.BytesRetransmitted = %d, want = %d", got, want)
+	}
+	if got, want := info.Unacked, uint32(1); got != want {
+		t.Errorf("got info.Unacked = %d, want = %d", got, want)
+	}
+	if got, want := info.CcState, tcpip.RTORecovery; got != want {
+		t.Errorf("got info.CcState = %d, want = %d", got, want)
+	}
+
+	// Acknowledge the data and send some of our own.
+	iss := seqnum.Value(context.TestInitialSequenceNumber).Add(1)
+	c.SendPacket(make([]byte, dataLen), &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  iss,
+		AckNum:  c.IRS.Add(1 + dataLen),
+		RcvWnd:  30000,
+	})
+	v := c.GetPacket()
+	checker.IPv4(t, v,
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPAckNum(uint32(iss)+dataLen),
+		),
+	)
+	v.Release()
+
+	info = getInfo()
+	if got, want := info.Retransmits, uint32(0); got != want {
+		t.Errorf("got info.Retransmits = %d, want = %d", got, want)
+	}
+	if got, want := info.BytesAcked, uint64(dataLen); got != want {
+		t.Errorf("got info.BytesAcked = %d, want = %d", got, want)
+	}
+	if got, want := info.BytesReceived, uint64(dataLen); got != want {
+		t.Errorf("got info.BytesReceived = %d, want = %d", got, want)
+	}
+	if got, want := info.Unacked, uint32(0); got != want {
+		t.Errorf("got info.Unacked = %d, want = %d", got, want)
+	}
+	if got, want := info.SegmentsSent, stats.SegmentsSent.Value(); got != want {
+		t.Errorf("got info.SegmentsSent = %d, want = %d", got, want)
+	}
+	if got, want := info.SegmentsReceived, stats.SegmentsReceived.Value(); got != want {
+		t.Errorf("got info.SegmentsReceived = %d, want = %d", got, want)
+	}
+	// The retransmitted segment isn't used to sample the RTT, so only the
+	// handshake was measured.
+	if info.MinRTT > info.RTT {
+		t.Errorf("got info.MinRTT = %s, want <= info.RTT = %s", info.MinRTT, info.RTT)
+	}
+	if info.RTT != 0 && info.PacingRate == 0 {
+		t.Errorf("got info.PacingRate = 0, want > 0")
+	}
+	if info.DeliveryRate == 0 {
+		t.Errorf("got info.DeliveryRate = 0, want > 0")
+	}
+}
+
+func TestPacing(t *testing.T) {
+	const mtu = 1500
+	c := context.New(t, mtu)
+	defer c.Cleanup()
+
+	c.CreateConnected(context.TestInitialSequenceNumber, 65535 /* rcvWnd */, -1 /* epRcvBuf */)
+
+	const maxPayload = mtu - header.IPv4MinimumSize - header.TCPMinimumSize
+	const rate = 20 * maxPayload
+	c.EP.SocketOptions().SetMaxPacingRate(rate)
+
+	// Send the initial window, which isn't paced, and then some.
+	const numSegments = 2 * tcp.InitialCwnd
+	data := make([]byte, numSegments*maxPayload)
+	var r bytes.Reader
+	r.Reset(data)
+	if _, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+
+	bytesReceived := 0
+	recv := func() int {
+		v := c.GetPacket()
+		defer v.Release()
+		checker.IPv4(t, v,
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(c.IRS)+1+uint32(bytesReceived)),
+			),
+		)
+		n := len(header.TCP(header.IPv4(v.AsSlice()).Payload()).Payload())
+		bytesReceived += n
+		return n
+	}
+	for i := 0; i < tcp.InitialCwnd; i++ {
+		recv()
+	}
+	iss := seqnum.Value(context.TestInitialSequenceNumber).Add(1)
+	c.SendAck(iss, bytesReceived)
+
+	// The rest of the data fits in the congestion window, but must be
+	// spaced out according to the pacing rate. The first paced segment is
+	// sent immediately.
+	var want time.Duration
+	start := time.Now()
+	for n := recv(); bytesReceived < len(data); n = recv() {
+		want += time.Duration(n) * time.Second / rate
+	}
+	// Allow for some slack in when the segments are read.
+	if got := time.Since(start); got < want*3/4 {
+		t.Errorf("got %d paced bytes in %s, want at least %s at %d bytes/s", bytesReceived, got, want, rate)
+	}
+
+	var info tcpip.TCPInfoOption
+	if err := c.EP.GetSockOpt(&info); err != nil {
+		t.Fatalf("c.EP.GetSockOpt(&%T) = %s", info, err)
+	}
+	if info.PacingRate > rate {
+		t.Errorf("got info.PacingRate = %d, want <= %d", info.PacingRate, rate)
+	}
+}
+
 func TestFinImmediately(t *testing.T) {
 	c := context.New(t, e2e.DefaultMTU)
 	defer c.Cleanup()
@@ -8407,6 +8718,115 @@ func TestKeepaliveWithUserTimeout(t *testing.T) {
 	}
 }
 
+func TestKeepaliveUserTimeoutOverridesCount(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(context.TestInitialSequenceNumber, 30000, -1 /* epRcvBuf */)
+
+	waitEntry, notifyCh := waiter.NewChannelEntry(waiter.EventHUp)
+	c.WQ.EventRegister(&waitEntry)
+	defer c.WQ.EventUnregister(&waitEntry)
+
+	const keepAliveIdle = 100 * time.Millisecond
+	const keepAliveInterval = 100 * time.Millisecond
+	keepAliveIdleOption := tcpip.KeepaliveIdleOption(keepAliveIdle)
+	if err := c.EP.SetSockOpt(&keepAliveIdleOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", keepAliveIdleOption, keepAliveIdle, err)
+	}
+	keepAliveIntervalOption := tcpip.KeepaliveIntervalOption(keepAliveInterval)
+	if err := c.EP.SetSockOpt(&keepAliveIntervalOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", keepAliveIntervalOption, keepAliveInterval, err)
+	}
+	if err := c.EP.SetSockOptInt(tcpip.KeepaliveCountOption, 1); err != nil {
+		t.Fatalf("c.EP.SetSockOptInt(tcpip.KeepaliveCountOption, 1): %s", err)
+	}
+	// The user timeout allows many more unanswered probes than the
+	// keepalive count.
+	const userTimeout = time.Second
+	userTimeoutOption := tcpip.TCPUserTimeoutOption(userTimeout)
+	if err := c.EP.SetSockOpt(&userTimeoutOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", userTimeoutOption, userTimeout, err)
+	}
+	c.EP.SocketOptions().SetKeepAlive(true)
+
+	iss := seqnum.Value(context.TestInitialSequenceNumber).Add(1)
+	for i := 0; i < 3; i++ {
+		b := c.GetPacket()
+		defer b.Release()
+		checker.IPv4(t, b,
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(c.IRS)),
+				checker.TCPAckNum(uint32(iss)),
+				checker.TCPFlags(header.TCPFlagAck),
+			),
+		)
+	}
+
+	select {
+	case <-notifyCh:
+	case <-time.After(2 * userTimeout):
+		t.Fatalf("connection still alive after %s, should have been closed after %s", 2*userTimeout, userTimeout)
+	}
+	ept := endpointTester{c.EP}
+	ept.CheckReadError(t, &tcpip.ErrTimeout{})
+}
+
+func TestKeepaliveCountChangeAfterProbes(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(context.TestInitialSequenceNumber, 30000, -1 /* epRcvBuf */)
+
+	waitEntry, notifyCh := waiter.NewChannelEntry(waiter.EventHUp)
+	c.WQ.EventRegister(&waitEntry)
+	defer c.WQ.EventUnregister(&waitEntry)
+
+	const keepAliveIdle = 100 * time.Millisecond
+	const keepAliveInterval = 500 * time.Millisecond
+	keepAliveIdleOption := tcpip.KeepaliveIdleOption(keepAliveIdle)
+	if err := c.EP.SetSockOpt(&keepAliveIdleOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", keepAliveIdleOption, keepAliveIdle, err)
+	}
+	keepAliveIntervalOption := tcpip.KeepaliveIntervalOption(keepAliveInterval)
+	if err := c.EP.SetSockOpt(&keepAliveIntervalOption); err != nil {
+		t.Fatalf("c.EP.SetSockOpt(&%T(%s)): %s", keepAliveIntervalOption, keepAliveInterval, err)
+	}
+	if err := c.EP.SetSockOptInt(tcpip.KeepaliveCountOption, 10); err != nil {
+		t.Fatalf("c.EP.SetSockOptInt(tcpip.KeepaliveCountOption, 10): %s", err)
+	}
+	c.EP.SocketOptions().SetKeepAlive(true)
+
+	// Receive 2 keepalives, but don't ACK them.
+	iss := seqnum.Value(context.TestInitialSequenceNumber).Add(1)
+	for i := 0; i < 2; i++ {
+		b := c.GetPacket()
+		defer b.Release()
+		checker.IPv4(t, b,
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(uint32(c.IRS)),
+				checker.TCPAckNum(uint32(iss)),
+				checker.TCPFlags(header.TCPFlagAck),
+			),
+		)
+	}
+
+	// Lowering the count applies to the probes that are already
+	// unanswered, so the connection is closed when the timer next fires.
+	if err := c.EP.SetSockOptInt(tcpip.KeepaliveCountOption, 2); err != nil {
+		t.Fatalf("c.EP.SetSockOptInt(tcpip.KeepaliveCountOption, 2): %s", err)
+	}
+	select {
+	case <-notifyCh:
+	case <-time.After(2 * keepAliveInterval):
+		t.Fatalf("connection still alive after %s, should have been closed after %s", 2*keepAliveInterval, keepAliveInterval)
+	}
+	ept := endpointTester{c.EP}
+	ept.CheckReadError(t, &tcpip.ErrTimeout{})
+}
+
 func TestIncreaseWindowOnRead(t *testing.T) {
 	// This test ensures that the endpoint sends an ack,
 	// after read() when the window grows by more than 1 MSS.
@@ -91,6 +91,10 @@ type endpoint struct {
 
 	readShutdown bool
 
+	// gsoSize is the size of the datagrams that writes are segmented into, as
+	// set by UDPSegmentOption.
+	gsoSize uint16
+
 	// effectiveNetProtos contains the network protocols actually in use. In
 	// most cases it will only contain "netProto", but in cases like IPv6
 	// endpoints with v6only set to false, this could include multiple
@@ -236,10 +240,23 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 	}
 
 	p := e.rcvList.Front()
+	var coalesced []*udpPacket
+	if e.ops.GetUDPGRO() {
+		coalesced = e.coalescableLocked(p)
+	}
 	if !opts.Peek {
 		e.rcvList.Remove(p)
 		defer p.pkt.DecRef()
 		e.rcvBufSize -= p.pkt.Data().Size()
+		for _, q := range coalesced {
+			e.rcvList.Remove(q)
+			e.rcvBufSize -= q.pkt.Data().Size()
+		}
+		defer func() {
+			for _, q := range coalesced {
+				q.pkt.DecRef()
+			}
+		}()
 	}
 	e.rcvMu.Unlock()
 
@@ -290,11 +307,19 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 		cm.OriginalDstAddress = p.destinationAddress
 	}
 
+	if len(coalesced) != 0 {
+		cm.HasGROSize = true
+		cm.GROSize = uint16(p.pkt.Data().Size())
+	}
+
 	// Read Result
 	res := tcpip.ReadResult{
 		Total:           p.pkt.Data().Size(),
 		ControlMessages: cm,
 	}
+	for _, q := range coalesced {
+		res.Total += q.pkt.Data().Size()
+	}
 	if opts.NeedRemoteAddr {
 		res.RemoteAddr = p.senderAddress
 	}
@@ -304,9 +329,56 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 		return res, &tcpip.ErrBadBuffer{}
 	}
 	res.Count = n
+	for _, q := range coalesced {
+		if err != nil {
+			// dst is full.
+			break
+		}
+		n, err = q.pkt.Data().ReadTo(dst, opts.Peek)
+		res.Count += n
+	}
 	return res, nil
 }
 
+// maxGROSegments is the maximum number of datagrams that may be coalesced
+// into a single read.
+const maxGROSegments = maxGSOSegments
+
+// coalescableLocked returns the packets following p in the receive queue that
+// may be coalesced with it into a single read when UDP_GRO is enabled. As with
+// GRO in Linux, these are consecutive datagrams of the same flow that are all
+// the size of p, except for the last one, which may be shorter.
+//
+// +checklocks:e.rcvMu
+func (e *endpoint) coalescableLocked(p *udpPacket) []*udpPacket {
+	segSize := p.pkt.Data().Size()
+	if segSize == 0 {
+		return nil
+	}
+	total := segSize
+	var pkts []*udpPacket
+	for q := p.Next(); q != nil && len(pkts)+1 < maxGROSegments; q = q.Next() {
+		size := q.pkt.Data().Size()
+		if size == 0 || size > segSize || total+size > header.UDPMaximumPacketSize {
+			break
+		}
+		if q.netProto != p.netProto ||
+			q.senderAddress != p.senderAddress ||
+			q.destinationAddress != p.destinationAddress ||
+			q.packetInfo != p.packetInfo ||
+			q.tosOrTClass != p.tosOrTClass ||
+			q.ttlOrHopLimit != p.ttlOrHopLimit {
+			break
+		}
+		pkts = append(pkts, q)
+		total += size
+		if size < segSize {
+			break
+		}
+	}
+	return pkts
+}
+
 // prepareForWriteInner prepares the endpoint for sending data. In particular,
 // it binds it if it's still in the initial state. To do so, it must first
 // reacquire the mutex in exclusive mode.
@@ -440,11 +512,17 @@ func (e *endpoint) prepareForWrite(p tcpip.Payloader, opts tcpip.WriteOptions) (
 		return udpPacketInfo{}, &tcpip.ErrBadBuffer{}
 	}
 
+	gsoSize := e.gsoSize
+	if opts.ControlMessages.HasGSOSize {
+		gsoSize = opts.ControlMessages.GSOSize
+	}
+
 	return udpPacketInfo{
 		ctx:        ctx,
 		data:       buf,
 		localPort:  e.localPort,
 		remotePort: dst.Port,
+		gsoSize:    gsoSize,
 	}, nil
 }
 
@@ -471,12 +549,149 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 	defer udpInfo.ctx.Release()
 
 	dataSz := udpInfo.data.Size()
-	pktInfo := udpInfo.ctx.PacketInfo()
-	pkt := udpInfo.ctx.TryNewPacketBuffer(header.UDPMinimumSize+int(pktInfo.MaxHeaderLength), udpInfo.data)
+	if udpInfo.gsoSize != 0 {
+		if err := e.writeSegmented(&udpInfo); err != nil {
+			return 0, err
+		}
+		return dataSz, nil
+	}
+
+	pkt := e.newDatagram(&udpInfo, udpInfo.data, stack.GSO{})
 	if pkt.IsNil() {
 		return 0, &tcpip.ErrWouldBlock{}
 	}
 	defer pkt.DecRef()
+	pkt.TXTimestamp = e.txTimestamp()
+
+	if err := udpInfo.ctx.WritePacket(pkt, false /* headerIncluded */); err != nil {
+		e.stack.Stats().UDP.PacketSendErrors.Increment()
+		return 0, err
+	}
+
+	// Track count of packets sent.
+	e.stack.Stats().UDP.PacketsSent.Increment()
+	return int64(dataSz), nil
+}
+
+// maxGSOSegments is the maximum number of datagrams that a single write may
+// be segmented into, as UDP_MAX_SEGMENTS in Linux.
+const maxGSOSegments = 64
+
+// writeSegmented writes udpInfo.data as a series of datagrams of
+// udpInfo.gsoSize bytes each, except for the last one, which may be shorter.
+// If the route supports host GSO, the datagrams are written as a single packet
+// to be segmented by the host.
+//
+// Either all of the datagrams are written or none of them are.
+func (e *endpoint) writeSegmented(udpInfo *udpPacketInfo) tcpip.Error {
+	pktInfo := udpInfo.ctx.PacketInfo()
+	gsoSize := int64(udpInfo.gsoSize)
+	dataSz := udpInfo.data.Size()
+
+	// The following checks match udp_send_skb() in Linux. Every datagram
+	// must be checksummed, so SO_NO_CHECK can't be used with segmentation.
+	if header.UDPMinimumSize+gsoSize > int64(udpInfo.ctx.MTU()) ||
+		dataSz > gsoSize*maxGSOSegments ||
+		e.ops.GetNoChecksum() {
+		udpInfo.data.Release()
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+
+	if dataSz <= gsoSize {
+		pkt := e.newDatagram(udpInfo, udpInfo.data, stack.GSO{})
+		if pkt.IsNil() {
+			return &tcpip.ErrWouldBlock{}
+		}
+		defer pkt.DecRef()
+		return e.writeDatagrams([]stack.PacketBufferPtr{pkt}, udpInfo)
+	}
+
+	if maxSize := udpInfo.ctx.HostGSOMaxSize(); header.UDPMinimumSize+dataSz <= int64(maxSize)-header.IPv4MaximumHeaderSize {
+		gso := stack.GSO{
+			Type:       stack.GSOUDPL4,
+			NeedsCsum:  true,
+			CsumOffset: header.UDPChecksumOffset,
+			MSS:        udpInfo.gsoSize,
+			MaxSize:    maxSize,
+		}
+		switch pktInfo.NetProto {
+		case header.IPv4ProtocolNumber:
+			gso.L3HdrLen = header.IPv4MinimumSize
+		case header.IPv6ProtocolNumber:
+			gso.L3HdrLen = header.IPv6MinimumSize
+		default:
+			panic(fmt.Sprintf("unrecognized network protocol = %d", pktInfo.NetProto))
+		}
+		pkt := e.newDatagram(udpInfo, udpInfo.data, gso)
+		if pkt.IsNil() {
+			return &tcpip.ErrWouldBlock{}
+		}
+		defer pkt.DecRef()
+		return e.writeDatagrams([]stack.PacketBufferPtr{pkt}, udpInfo)
+	}
+
+	// Segment the payload here. All of the datagrams are allocated before any
+	// of them are written so that the write fails as a whole if the send
+	// buffer is full.
+	defer udpInfo.data.Release()
+	pkts := make([]stack.PacketBufferPtr, 0, (dataSz+gsoSize-1)/gsoSize)
+	defer func() {
+		for _, pkt := range pkts {
+			pkt.DecRef()
+		}
+	}()
+	for off := int64(0); off < dataSz; off += gsoSize {
+		seg := udpInfo.data.Clone()
+		seg.TrimFront(off)
+		if seg.Size() > gsoSize {
+			seg.Truncate(gsoSize)
+		}
+		pkt := e.newDatagram(udpInfo, seg, stack.GSO{})
+		if pkt.IsNil() {
+			seg.Release()
+			return &tcpip.ErrWouldBlock{}
+		}
+		pkts = append(pkts, pkt)
+	}
+	return e.writeDatagrams(pkts, udpInfo)
+}
+
+// writeDatagrams writes the given datagrams in order, stopping at the first
+// error. As in Linux, a transmit timestamp is only reported for the last
+// datagram.
+func (e *endpoint) writeDatagrams(pkts []stack.PacketBufferPtr, udpInfo *udpPacketInfo) tcpip.Error {
+	pkts[len(pkts)-1].TXTimestamp = e.txTimestamp()
+	for _, pkt := range pkts {
+		if err := udpInfo.ctx.WritePacket(pkt, false /* headerIncluded */); err != nil {
+			e.stack.Stats().UDP.PacketSendErrors.Increment()
+			return err
+		}
+		e.stack.Stats().UDP.PacketsSent.Increment()
+	}
+	return nil
+}
+
+// txTimestamp returns the PacketBuffer.TXTimestamp function for a datagram
+// written by the endpoint, or nil if SO_TIMESTAMPING transmit timestamps are
+// disabled.
+func (e *endpoint) txTimestamp() func(stack.PacketBufferPtr) {
+	if e.ops.GetTimestamping()&tcpip.TimestampingTXSoftware == 0 {
+		return nil
+	}
+	return stack.NewTXTimestamp(e.stack.Clock(), &e.ops, e.ops.NextDatagramTimestampingKey(), e.waiterQueue)
+}
+
+// newDatagram returns a packet holding a UDP datagram with the given payload,
+// or a nil packet if the endpoint's send buffer is full. If gso requires a
+// partial checksum, only the pseudo-header checksum is stored in the UDP
+// header.
+func (e *endpoint) newDatagram(udpInfo *udpPacketInfo, data bufferv2.Buffer, gso stack.GSO) stack.PacketBufferPtr {
+	pktInfo := udpInfo.ctx.PacketInfo()
+	pkt := udpInfo.ctx.TryNewPacketBuffer(header.UDPMinimumSize+int(pktInfo.MaxHeaderLength), data)
+	if pkt.IsNil() {
+		return pkt
+	}
+	pkt.GSOOptions = gso
 
 	// Initialize the UDP header.
 	udp := header.UDP(pkt.TransportHeader().Push(header.UDPMinimumSize))
@@ -489,16 +704,21 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 		Length:  length,
 	})
 
+	xsum := header.PseudoHeaderChecksum(ProtocolNumber, pktInfo.LocalAddress, pktInfo.RemoteAddress, length)
+	if gso.Type != stack.GSONone && gso.NeedsCsum {
+		// As in TCP, the rest of the checksum is calculated when the packet
+		// is segmented.
+		udp.SetChecksum(xsum)
+		return pkt
+	}
+
 	// Set the checksum field unless TX checksum offload is enabled.
 	// On IPv4, UDP checksum is optional, and a zero value indicates the
 	// transmitter skipped the checksum generation (RFC768).
 	// On IPv6, UDP checksum is not optional (RFC2460 Section 8.1).
 	if pktInfo.RequiresTXTransportChecksum &&
 		(!e.ops.GetNoChecksum() || pktInfo.NetProto == header.IPv6ProtocolNumber) {
-		xsum := udp.CalculateChecksum(checksum.Combine(
-			header.PseudoHeaderChecksum(ProtocolNumber, pktInfo.LocalAddress, pktInfo.RemoteAddress, length),
-			pkt.Data().Checksum(),
-		))
+		xsum = udp.CalculateChecksum(checksum.Combine(xsum, pkt.Data().Checksum()))
 		// As per RFC 768 page 2,
 		//
 		//   Checksum is the 16-bit one's complement of the one's complement sum of
@@ -523,14 +743,7 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 		}
 		udp.SetChecksum(xsum)
 	}
-	if err := udpInfo.ctx.WritePacket(pkt, false /* headerIncluded */); err != nil {
-		e.stack.Stats().UDP.PacketSendErrors.Increment()
-		return 0, err
-	}
-
-	// Track count of packets sent.
-	e.stack.Stats().UDP.PacketsSent.Increment()
-	return int64(dataSz), nil
+	return pkt
 }
 
 // OnReuseAddressSet implements tcpip.SocketOptionsHandler.
@@ -549,7 +762,19 @@ func (e *endpoint) OnReusePortSet(v bool) {
 
 // SetSockOptInt implements tcpip.Endpoint.
 func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
-	return e.net.SetSockOptInt(opt, v)
+	switch opt {
+	case tcpip.UDPSegmentOption:
+		if v < 0 || v > math.MaxUint16 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.mu.Lock()
+		e.gsoSize = uint16(v)
+		e.mu.Unlock()
+		return nil
+
+	default:
+		return e.net.SetSockOptInt(opt, v)
+	}
 }
 
 var _ tcpip.SocketOptionsHandler = (*endpoint)(nil)
@@ -577,6 +802,18 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 		e.rcvMu.Unlock()
 		return v, nil
 
+	case tcpip.ReceiveBufferUsedOption:
+		e.rcvMu.Lock()
+		v := e.rcvBufSize
+		e.rcvMu.Unlock()
+		return v, nil
+
+	case tcpip.UDPSegmentOption:
+		e.mu.RLock()
+		v := int(e.gsoSize)
+		e.mu.RUnlock()
+		return v, nil
+
 	default:
 		return e.net.GetSockOptInt(opt)
 	}
@@ -593,6 +830,10 @@ type udpPacketInfo struct {
 	data       bufferv2.Buffer
 	localPort  uint16
 	remotePort uint16
+
+	// gsoSize is the size of the datagrams that data is segmented into, or
+	// zero if data is written as a single datagram.
+	gsoSize uint16
 }
 
 // Disconnect implements tcpip.Endpoint.
@@ -894,7 +1135,9 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 	e.lastErrorMu.Lock()
 	hasError := e.lastError != nil
 	e.lastErrorMu.Unlock()
-	if hasError {
+	// Like Linux, also report an error if there are errors in the error
+	// queue, e.g. transmit timestamps.
+	if hasError || (mask&waiter.EventErr != 0 && e.ops.HasQueuedErr()) {
 		result |= waiter.EventErr
 	}
 	return result
@@ -927,6 +1170,32 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt stack.PacketBu
 		return
 	}
 
+	// Like Linux, run the socket filter before the packet is accounted against
+	// the receive buffer. The filter sees the UDP header, and may truncate the
+	// payload but not the header.
+	if e.ops.HasFilter() {
+		data := make([]byte, 0, len(hdr)+pkt.Data().Size())
+		data = append(data, hdr...)
+		data = append(data, pkt.Data().AsRange().ToSlice()...)
+		n := e.ops.RunFilter(data, tcpip.SocketFilterInfo{
+			Protocol: pkt.NetworkProtocolNumber,
+			PktType:  pkt.PktType,
+			NIC:      pkt.NICID,
+		})
+		if n == 0 {
+			return
+		}
+		if n < len(data) {
+			if n < len(hdr) {
+				n = len(hdr)
+			}
+			// pkt may be delivered to other endpoints too.
+			pkt = pkt.Clone()
+			defer pkt.DecRef()
+			pkt.Data().CapLength(n - len(hdr))
+		}
+	}
+
 	e.stack.Stats().UDP.PacketsReceived.Increment()
 	e.stats.PacketsReceived.Increment()
 
@@ -984,7 +1253,7 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt stack.PacketBu
 	packet.packetInfo.LocalAddr = localAddr
 	packet.packetInfo.DestinationAddr = localAddr
 	packet.packetInfo.NIC = pkt.NICID
-	packet.receivedAt = e.stack.Clock().Now()
+	packet.receivedAt = pkt.ReceivedAt
 
 	e.rcvMu.Unlock()
 
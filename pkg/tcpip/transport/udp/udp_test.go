@@ -2265,6 +2265,402 @@ func TestWritePayloadSizeTooBig(t *testing.T) {
 	}
 }
 
+// readUDPSegments reads the datagrams that a segmented write of payload is
+// expected to produce from c.LinkEP, and checks that each of them holds the
+// right part of payload with a valid checksum.
+func readUDPSegments(c *context.Context, flow context.TestFlow, payload []byte, gsoSize int) {
+	c.T.Helper()
+
+	h := flow.MakeHeader4Tuple(context.Outgoing)
+	for off := 0; off < len(payload); off += gsoSize {
+		end := off + gsoSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		want := payload[off:end]
+
+		p := c.LinkEP.Read()
+		if p.IsNil() {
+			c.T.Fatalf("datagram at offset %d wasn't written out", off)
+		}
+		v := p.ToView()
+		p.DecRef()
+
+		flow.CheckerFn()(c.T, v,
+			checker.SrcAddr(h.Src.Addr),
+			checker.DstAddr(h.Dst.Addr),
+			checker.UDP(checker.DstPort(h.Dst.Port), checker.Payload(want)),
+		)
+
+		var src, dst tcpip.Address
+		var udpH header.UDP
+		if flow.IsV4() {
+			ip := header.IPv4(v.AsSlice())
+			src, dst, udpH = ip.SourceAddress(), ip.DestinationAddress(), ip.Payload()
+		} else {
+			ip := header.IPv6(v.AsSlice())
+			src, dst, udpH = ip.SourceAddress(), ip.DestinationAddress(), ip.Payload()
+		}
+		if got, want := int(udpH.Length()), header.UDPMinimumSize+len(want); got != want {
+			c.T.Errorf("got udpH.Length() = %d, want = %d", got, want)
+		}
+		if !udpH.IsChecksumValid(src, dst, checksum.Checksum(udpH.Payload(), 0)) {
+			c.T.Errorf("datagram at offset %d has an invalid checksum %#x", off, udpH.Checksum())
+		}
+		v.Release()
+	}
+	if p := c.LinkEP.Read(); !p.IsNil() {
+		p.DecRef()
+		c.T.Fatal("got an unexpected extra datagram")
+	}
+}
+
+func TestUDPSegment(t *testing.T) {
+	for _, flow := range []context.TestFlow{context.UnicastV4, context.UnicastV6} {
+		for _, test := range []struct {
+			name        string
+			payloadSize int
+			gsoSize     int
+			useCmsg     bool
+		}{
+			{name: "full segments", payloadSize: 3000, gsoSize: 1000},
+			{name: "short last segment", payloadSize: 2501, gsoSize: 1000},
+			{name: "one byte last segment", payloadSize: 1001, gsoSize: 1000},
+			{name: "single segment", payloadSize: 999, gsoSize: 1000},
+			{name: "control message", payloadSize: 2500, gsoSize: 1000, useCmsg: true},
+		} {
+			t.Run(fmt.Sprintf("%s/%s", flow, test.name), func(t *testing.T) {
+				c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol})
+				defer c.Cleanup()
+
+				c.CreateEndpointForFlow(flow, udp.ProtocolNumber)
+
+				writeOpts := getWriteOptionsForFlow(flow)
+				if test.useCmsg {
+					writeOpts.ControlMessages.HasGSOSize = true
+					writeOpts.ControlMessages.GSOSize = uint16(test.gsoSize)
+				} else if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, test.gsoSize); err != nil {
+					c.T.Fatalf("SetSockOptInt(UDPSegmentOption, %d): %s", test.gsoSize, err)
+				}
+
+				payload := newRandomPayload(test.payloadSize)
+				var r bytes.Reader
+				r.Reset(payload)
+				n, err := c.EP.Write(&r, writeOpts)
+				if err != nil {
+					c.T.Fatalf("Write failed: %s", err)
+				}
+				if n != int64(len(payload)) {
+					c.T.Fatalf("got n = %d, want = %d", n, len(payload))
+				}
+
+				readUDPSegments(c, flow, payload, test.gsoSize)
+			})
+		}
+	}
+}
+
+func TestUDPSegmentHostGSO(t *testing.T) {
+	for _, flow := range []context.TestFlow{context.UnicastV4, context.UnicastV6} {
+		t.Run(flow.String(), func(t *testing.T) {
+			c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol})
+			defer c.Cleanup()
+
+			c.LinkEP.SupportedGSOKind = stack.HostGSOSupported
+			c.CreateEndpointForFlow(flow, udp.ProtocolNumber)
+
+			const gsoSize = 1000
+			if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, gsoSize); err != nil {
+				c.T.Fatalf("SetSockOptInt(UDPSegmentOption, %d): %s", gsoSize, err)
+			}
+
+			payload := newRandomPayload(2500)
+			var r bytes.Reader
+			r.Reset(payload)
+			if _, err := c.EP.Write(&r, getWriteOptionsForFlow(flow)); err != nil {
+				c.T.Fatalf("Write failed: %s", err)
+			}
+
+			// The payload is left for the host to segment.
+			p := c.LinkEP.Read()
+			if p.IsNil() {
+				c.T.Fatal("Packet wasn't written out")
+			}
+			defer p.DecRef()
+			if got, want := p.GSOOptions.Type, stack.GSOUDPL4; got != want {
+				c.T.Errorf("got p.GSOOptions.Type = %d, want = %d", got, want)
+			}
+			if got, want := p.GSOOptions.MSS, uint16(gsoSize); got != want {
+				c.T.Errorf("got p.GSOOptions.MSS = %d, want = %d", got, want)
+			}
+			if !p.GSOOptions.NeedsCsum || p.GSOOptions.CsumOffset != header.UDPChecksumOffset {
+				c.T.Errorf("got p.GSOOptions = %+v, want a partial checksum at offset %d", p.GSOOptions, header.UDPChecksumOffset)
+			}
+
+			v := p.ToView()
+			defer v.Release()
+			h := flow.MakeHeader4Tuple(context.Outgoing)
+			length := uint16(header.UDPMinimumSize + len(payload))
+			flow.CheckerFn()(c.T, v,
+				checker.UDP(
+					checker.Payload(payload),
+					// Only the pseudo-header checksum is filled in.
+					checker.TransportChecksum(header.PseudoHeaderChecksum(udp.ProtocolNumber, h.Src.Addr, h.Dst.Addr, length)),
+				),
+			)
+		})
+	}
+}
+
+func TestUDPSegmentInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		payloadSize int
+		gsoSize     int
+		noChecksum  bool
+	}{
+		{name: "segment larger than MTU", payloadSize: 3000, gsoSize: 1500},
+		{name: "segment larger than MTU without segmentation", payloadSize: 100, gsoSize: 1500},
+		{name: "too many segments", payloadSize: 65*100 + 1, gsoSize: 100},
+		{name: "no checksum", payloadSize: 3000, gsoSize: 1000, noChecksum: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := context.NewWithOptions(t, []stack.TransportProtocolFactory{udp.NewProtocol}, context.Options{
+				MTU:         1500,
+				HandleLocal: true,
+			})
+			defer c.Cleanup()
+
+			c.CreateEndpointForFlow(context.UnicastV4, udp.ProtocolNumber)
+			c.EP.SocketOptions().SetNoChecksum(test.noChecksum)
+			if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, test.gsoSize); err != nil {
+				c.T.Fatalf("SetSockOptInt(UDPSegmentOption, %d): %s", test.gsoSize, err)
+			}
+
+			testWriteFails(c, context.UnicastV4, test.payloadSize, &tcpip.ErrInvalidOptionValue{})
+			if p := c.LinkEP.Read(); !p.IsNil() {
+				p.DecRef()
+				c.T.Fatal("got an unexpected datagram")
+			}
+		})
+	}
+
+	c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol})
+	defer c.Cleanup()
+	c.CreateEndpoint(ipv4.ProtocolNumber, udp.ProtocolNumber)
+	for _, v := range []int{-1, math.MaxUint16 + 1} {
+		if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, v); err != (&tcpip.ErrInvalidOptionValue{}) {
+			t.Errorf("got SetSockOptInt(UDPSegmentOption, %d) = %v, want = %s", v, err, &tcpip.ErrInvalidOptionValue{})
+		}
+	}
+}
+
+func TestUDPGRO(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		disabled  bool
+		sizes     []int
+		wantReads [][]int
+	}{
+		{
+			name:      "disabled",
+			disabled:  true,
+			sizes:     []int{100, 100},
+			wantReads: [][]int{{100}, {100}},
+		},
+		{
+			name:      "short last segment",
+			sizes:     []int{100, 100, 40},
+			wantReads: [][]int{{100, 100, 40}},
+		},
+		{
+			name:      "coalescing stops after short segment",
+			sizes:     []int{100, 40, 100, 100},
+			wantReads: [][]int{{100, 40}, {100, 100}},
+		},
+		{
+			name:      "coalescing stops at larger segment",
+			sizes:     []int{40, 100},
+			wantReads: [][]int{{40}, {100}},
+		},
+		{
+			name:      "segment limit",
+			sizes:     repeatInt(10, 65),
+			wantReads: [][]int{repeatInt(10, 64), {10}},
+		},
+	} {
+		for _, flow := range []context.TestFlow{context.UnicastV4, context.UnicastV6} {
+			t.Run(fmt.Sprintf("%s/%s", flow, test.name), func(t *testing.T) {
+				c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol})
+				defer c.Cleanup()
+
+				c.CreateEndpointForFlow(flow, udp.ProtocolNumber)
+				if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+					c.T.Fatalf("Bind failed: %s", err)
+				}
+				c.EP.SocketOptions().SetUDPGRO(!test.disabled)
+
+				var payloads [][]byte
+				for _, size := range test.sizes {
+					payload := newRandomPayload(size)
+					payloads = append(payloads, payload)
+					c.InjectPacket(flow.NetProto(), context.BuildUDPPacket(payload, flow, context.Incoming, testTOS, testTTL, false))
+				}
+
+				for i, sizes := range test.wantReads {
+					var want []byte
+					for range sizes {
+						want = append(want, payloads[0]...)
+						payloads = payloads[1:]
+					}
+
+					var buf bytes.Buffer
+					res, err := c.EP.Read(&buf, tcpip.ReadOptions{})
+					if err != nil {
+						c.T.Fatalf("read %d: Read failed: %s", i, err)
+					}
+					if res.Count != len(want) || res.Total != len(want) {
+						c.T.Errorf("read %d: got (Count, Total) = (%d, %d), want = (%d, %d)", i, res.Count, res.Total, len(want), len(want))
+					}
+					if !bytes.Equal(buf.Bytes(), want) {
+						c.T.Errorf("read %d: got payload = %x, want = %x", i, buf.Bytes(), want)
+					}
+					cm := res.ControlMessages
+					if len(sizes) > 1 {
+						if !cm.HasGROSize || int(cm.GROSize) != sizes[0] {
+							c.T.Errorf("read %d: got (HasGROSize, GROSize) = (%t, %d), want = (true, %d)", i, cm.HasGROSize, cm.GROSize, sizes[0])
+						}
+					} else if cm.HasGROSize {
+						c.T.Errorf("read %d: got HasGROSize = true, want = false", i)
+					}
+				}
+				c.ReadFromEndpointExpectNoPacket()
+			})
+		}
+	}
+}
+
+// repeatInt returns a slice holding n copies of v.
+func repeatInt(v, n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = v
+	}
+	return s
+}
+
+// lengthFilter is a tcpip.SocketFilter that delivers at most n bytes of each
+// packet, and records the packets it sees.
+type lengthFilter struct {
+	n     uint32
+	seen  int
+	infos []tcpip.SocketFilterInfo
+}
+
+// Filter implements tcpip.SocketFilter.Filter.
+func (f *lengthFilter) Filter(data []byte, info tcpip.SocketFilterInfo) uint32 {
+	f.seen = len(data)
+	f.infos = append(f.infos, info)
+	return f.n
+}
+
+func TestSocketFilter(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		n           uint32
+		wantPayload int
+		wantDrop    bool
+	}{
+		{
+			name:        "accept",
+			n:           math.MaxUint32,
+			wantPayload: arbitraryPayloadSize,
+		},
+		{
+			name:     "drop",
+			n:        0,
+			wantDrop: true,
+		},
+		{
+			name:        "truncate payload",
+			n:           header.UDPMinimumSize + 10,
+			wantPayload: 10,
+		},
+		{
+			name:        "truncate header",
+			n:           header.UDPMinimumSize / 2,
+			wantPayload: 0,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol})
+			defer c.Cleanup()
+
+			c.CreateEndpointForFlow(context.UnicastV4, udp.ProtocolNumber)
+			if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+				c.T.Fatalf("Bind failed: %s", err)
+			}
+
+			filter := lengthFilter{n: test.n}
+			if err := c.EP.SocketOptions().SetFilter(&filter); err != nil {
+				t.Fatalf("SetFilter failed: %s", err)
+			}
+
+			payload := newRandomPayload(arbitraryPayloadSize)
+			c.InjectPacket(header.IPv4ProtocolNumber, context.BuildUDPPacket(payload, context.UnicastV4, context.Incoming, testTOS, testTTL, false))
+			if got, want := filter.seen, header.UDPMinimumSize+len(payload); got != want {
+				t.Errorf("filter saw %d bytes, want %d", got, want)
+			}
+			wantInfo := tcpip.SocketFilterInfo{Protocol: header.IPv4ProtocolNumber, NIC: context.NICID}
+			if len(filter.infos) != 1 || filter.infos[0] != wantInfo {
+				t.Errorf("filter saw packets with infos %+v, want [%+v]", filter.infos, wantInfo)
+			}
+
+			if test.wantDrop {
+				if v, err := c.EP.GetSockOptInt(tcpip.ReceiveQueueSizeOption); err != nil || v != 0 {
+					t.Errorf("got GetSockOptInt(ReceiveQueueSizeOption) = (%d, %v), want = (0, nil)", v, err)
+				}
+				c.ReadFromEndpointExpectNoPacket()
+				return
+			}
+			c.ReadFromEndpointExpectSuccess(payload[:test.wantPayload], context.UnicastV4)
+		})
+	}
+}
+
+func TestSocketFilterDetachAndLock(t *testing.T) {
+	c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol})
+	defer c.Cleanup()
+
+	c.CreateEndpointForFlow(context.UnicastV4, udp.ProtocolNumber)
+	ops := c.EP.SocketOptions()
+
+	if err := ops.DetachFilter(); err != (&tcpip.ErrNoSuchFile{}) {
+		t.Errorf("got DetachFilter() = %v, want = %s", err, &tcpip.ErrNoSuchFile{})
+	}
+	if err := ops.SetFilter(&lengthFilter{}); err != nil {
+		t.Fatalf("SetFilter failed: %s", err)
+	}
+	if err := ops.SetFilterLocked(true); err != nil {
+		t.Fatalf("SetFilterLocked(true) failed: %s", err)
+	}
+	if !ops.GetFilterLocked() {
+		t.Errorf("got GetFilterLocked() = false, want = true")
+	}
+	if err := ops.DetachFilter(); err != (&tcpip.ErrNotPermitted{}) {
+		t.Errorf("got DetachFilter() = %v, want = %s", err, &tcpip.ErrNotPermitted{})
+	}
+	if err := ops.SetFilter(&lengthFilter{}); err != (&tcpip.ErrNotPermitted{}) {
+		t.Errorf("got SetFilter(_) = %v, want = %s", err, &tcpip.ErrNotPermitted{})
+	}
+	if err := ops.SetFilterLocked(false); err != (&tcpip.ErrNotPermitted{}) {
+		t.Errorf("got SetFilterLocked(false) = %v, want = %s", err, &tcpip.ErrNotPermitted{})
+	}
+	if !ops.HasFilter() {
+		t.Errorf("got HasFilter() = false, want = true")
+	}
+}
+
 func TestMain(m *testing.M) {
 	refs.SetLeakMode(refs.LeaksPanic)
 	code := m.Run()
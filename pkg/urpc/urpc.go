@@ -45,6 +45,10 @@ var ErrTooManyFiles = errors.New("too many files")
 // ErrUnknownMethod is returned when a method is not known.
 var ErrUnknownMethod = errors.New("unknown method")
 
+// ErrTimeout is returned by CallTimeout when no response arrived before the
+// timeout expired.
+var ErrTimeout = errors.New("timed out")
+
 // errStopped is an internal error indicating the server has been stopped.
 var errStopped = errors.New("stopped")
 
@@ -660,6 +664,29 @@ func (c *Client) Call(method string, arg interface{}, result interface{}) error
 	return nil
 }
 
+// CallTimeout is like Call, but stops waiting for the response once timeout
+// has elapsed, in which case ErrTimeout is returned. A response that was
+// received before the timeout expired is always returned, even if the timeout
+// fires while it is being processed. A timeout <= 0 waits indefinitely.
+//
+// The underlying socket is shut down when the call times out, so the client
+// can't be used for further calls.
+func (c *Client) CallTimeout(method string, arg interface{}, result interface{}, timeout time.Duration) error {
+	if timeout <= 0 {
+		return c.Call(method, arg, result)
+	}
+
+	// Shutdown doesn't take c.mu, so it unblocks the read in Call below.
+	t := time.AfterFunc(timeout, func() {
+		c.Socket.Shutdown()
+	})
+	err := c.Call(method, arg, result)
+	if !t.Stop() && err != nil {
+		return ErrTimeout
+	}
+	return err
+}
+
 // Close closes the underlying socket.
 //
 // Further calls to the client may result in undefined behavior.
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/unet"
 )
@@ -67,6 +68,14 @@ func (t test) TooManyFiles(a *testArg, r *testResult) error {
 	return nil
 }
 
+// block is closed at the end of tests that call test.Block.
+var block = make(chan struct{})
+
+func (t test) Block(a *testArg, r *testResult) error {
+	<-block
+	return nil
+}
+
 func startServer(socket *unet.Socket) {
 	s := NewServer()
 	s.Register(test{})
@@ -208,3 +217,23 @@ func TestTooManyFiles(t *testing.T) {
 		t.Errorf("expected too many files, got %v", err.Error())
 	}
 }
+
+func TestCallTimeout(t *testing.T) {
+	c, err := testClient()
+	if err != nil {
+		t.Fatalf("error creating test client: %v", err)
+	}
+	defer c.Close()
+
+	var r testResult
+	if err := c.CallTimeout("test.Func", &testArg{StringArg: "hello"}, &r, time.Minute); err != nil {
+		t.Errorf("call with timeout failed: %v", err)
+	} else if r.StringResult != "hello" {
+		t.Errorf("unexpected result, got %v expected hello", r.StringResult)
+	}
+
+	defer close(block)
+	if err := c.CallTimeout("test.Block", &testArg{}, &r, 100*time.Millisecond); err != ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+}
@@ -130,6 +130,18 @@ type EventListener interface {
 	NotifyEvent(mask EventMask)
 }
 
+// ExclusiveEventListener provides a notify callback for exclusive waiter
+// entries. See Entry.InitExclusive.
+type ExclusiveEventListener interface {
+	EventListener
+
+	// NotifyEventExclusive is like NotifyEvent, but is called by
+	// Queue.Notify instead of NotifyEvent. It returns true if the
+	// notification woke up a waiter, in which case no further exclusive
+	// entries in the queue are notified.
+	NotifyEventExclusive(mask EventMask) bool
+}
+
 // Entry represents a waiter that can be add to the a wait queue. It can
 // only be in one queue at a time, and is added "intrusively" to the queue with
 // no extra memory allocations.
@@ -143,6 +155,11 @@ type Entry struct {
 
 	// mask should be immutable once queued.
 	mask EventMask
+
+	// exclusive is non-nil if the entry is exclusive, in which case it is
+	// the same listener as eventListener. exclusive should be immutable once
+	// queued.
+	exclusive ExclusiveEventListener
 }
 
 // Init initializes the Entry.
@@ -151,6 +168,23 @@ type Entry struct {
 func (e *Entry) Init(eventListener EventListener, mask EventMask) {
 	e.eventListener = eventListener
 	e.mask = mask
+	e.exclusive = nil
+}
+
+// InitExclusive initializes the Entry as an exclusive entry. Queue.Notify
+// notifies all non-exclusive entries, but stops notifying exclusive entries
+// after the first one whose listener reports that it woke up a waiter, like
+// entries added to a Linux wait queue with add_wait_queue_exclusive(). This
+// avoids waking up every waiter when only one of them can consume the event.
+//
+// Waitables that don't register entries with a Queue may treat exclusive
+// entries like any other.
+//
+// This must only be called when unregistered.
+func (e *Entry) InitExclusive(eventListener ExclusiveEventListener, mask EventMask) {
+	e.eventListener = eventListener
+	e.mask = mask
+	e.exclusive = eventListener
 }
 
 // Mask returns the entry mask.
@@ -207,26 +241,47 @@ func NewFunctionEntry(mask EventMask, fn func(EventMask)) (e Entry) {
 //
 // +stateify savable
 type Queue struct {
+	// list holds all non-exclusive entries, followed by all exclusive
+	// entries.
 	list waiterList
-	mu   sync.RWMutex `state:"nosave"`
+
+	// firstExclusive is the first exclusive entry in list, or nil if there
+	// are no exclusive entries.
+	firstExclusive *Entry
+
+	mu sync.RWMutex `state:"nosave"`
 }
 
 // EventRegister adds a waiter to the wait queue.
 func (q *Queue) EventRegister(e *Entry) {
 	q.mu.Lock()
-	q.list.PushBack(e)
+	switch {
+	case e.exclusive != nil:
+		q.list.PushBack(e)
+		if q.firstExclusive == nil {
+			q.firstExclusive = e
+		}
+	case q.firstExclusive != nil:
+		q.list.InsertBefore(q.firstExclusive, e)
+	default:
+		q.list.PushBack(e)
+	}
 	q.mu.Unlock()
 }
 
 // EventUnregister removes the given waiter entry from the wait queue.
 func (q *Queue) EventUnregister(e *Entry) {
 	q.mu.Lock()
+	if e == q.firstExclusive {
+		q.firstExclusive = e.Next()
+	}
 	q.list.Remove(e)
 	q.mu.Unlock()
 }
 
 // Notify notifies all waiters in the queue whose masks have at least one bit
-// in common with the notification mask.
+// in common with the notification mask. Exclusive entries are only notified
+// until one of them wakes up a waiter; see Entry.InitExclusive.
 func (q *Queue) Notify(mask EventMask) {
 	q.mu.RLock()
 	for e := q.list.Front(); e != nil; e = e.Next() {
@@ -234,6 +289,13 @@ func (q *Queue) Notify(mask EventMask) {
 		if m == 0 {
 			continue
 		}
+		if e.exclusive != nil {
+			if e.exclusive.NotifyEventExclusive(m) {
+				// All remaining entries are exclusive.
+				break
+			}
+			continue
+		}
 		e.eventListener.NotifyEvent(m) // Skip intermediate call.
 	}
 	q.mu.RUnlock()
@@ -180,3 +180,71 @@ func TestConcurrentNotification(t *testing.T) {
 		t.Errorf("cnt = %d, want %d", cnt.Load(), concurrency*waiterCount)
 	}
 }
+
+// exclusiveListener is an ExclusiveEventListener that counts notifications.
+type exclusiveListener struct {
+	cnt  int
+	wake bool
+}
+
+// NotifyEvent implements EventListener.NotifyEvent.
+func (l *exclusiveListener) NotifyEvent(EventMask) {
+	l.cnt++
+}
+
+// NotifyEventExclusive implements ExclusiveEventListener.NotifyEventExclusive.
+func (l *exclusiveListener) NotifyEventExclusive(EventMask) bool {
+	l.cnt++
+	return l.wake
+}
+
+func TestExclusive(t *testing.T) {
+	var q Queue
+	var (
+		ls      [3]exclusiveListener
+		es      [3]Entry
+		nonExcl int
+	)
+	for i := range es {
+		es[i].InitExclusive(&ls[i], EventIn)
+		q.EventRegister(&es[i])
+	}
+	// A non-exclusive entry registered after exclusive ones is still
+	// notified.
+	e := NewFunctionEntry(EventIn, func(EventMask) { nonExcl++ })
+	q.EventRegister(&e)
+	defer q.EventUnregister(&e)
+
+	// No listener wakes a waiter, so all of them are notified.
+	q.Notify(EventIn)
+	for i := range ls {
+		if ls[i].cnt != 1 {
+			t.Errorf("listener %d notified %d times, want 1", i, ls[i].cnt)
+		}
+	}
+	if nonExcl != 1 {
+		t.Errorf("non-exclusive entry notified %d times, want 1", nonExcl)
+	}
+
+	// Only the first listener that wakes a waiter is notified.
+	ls[1].wake = true
+	ls[2].wake = true
+	q.Notify(EventIn)
+	for i, want := range []int{2, 2, 1} {
+		if ls[i].cnt != want {
+			t.Errorf("listener %d notified %d times, want %d", i, ls[i].cnt, want)
+		}
+	}
+	if nonExcl != 2 {
+		t.Errorf("non-exclusive entry notified %d times, want 2", nonExcl)
+	}
+
+	// Once it is unregistered, the next one is.
+	q.EventUnregister(&es[1])
+	q.Notify(EventIn)
+	for i, want := range []int{3, 2, 2} {
+		if ls[i].cnt != want {
+			t.Errorf("listener %d notified %d times, want %d", i, ls[i].cnt, want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/tcpip/link/shaper"
+)
+
+const (
+	// ingressBandwidthAnnotation and egressBandwidthAnnotation limit the
+	// rate of the traffic received and sent by the sandbox on each of its
+	// external interfaces, as in Kubernetes; see ParseBandwidth.
+	ingressBandwidthAnnotation = "kubernetes.io/ingress-bandwidth"
+	egressBandwidthAnnotation  = "kubernetes.io/egress-bandwidth"
+
+	// ingressBurstAnnotation and egressBurstAnnotation set the burst
+	// allowed by the limits above; see ParseBurst.
+	ingressBurstAnnotation = "dev.gvisor.spec.net.ingress-burst"
+	egressBurstAnnotation  = "dev.gvisor.spec.net.egress-burst"
+)
+
+// bandwidthUnits maps the units accepted by ParseBandwidth to their value in
+// bits per second.
+var bandwidthUnits = map[string]float64{
+	// Kubernetes quantities.
+	"":   1,
+	"k":  1e3,
+	"M":  1e6,
+	"G":  1e9,
+	"T":  1e12,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+
+	// tc units, see tc(8).
+	"bit":   1,
+	"kbit":  1e3,
+	"mbit":  1e6,
+	"gbit":  1e9,
+	"tbit":  1e12,
+	"kibit": 1 << 10,
+	"mibit": 1 << 20,
+	"gibit": 1 << 30,
+	"tibit": 1 << 40,
+	"bps":   8,
+	"kbps":  8e3,
+	"mbps":  8e6,
+	"gbps":  8e9,
+	"tbps":  8e12,
+	"kibps": 8 << 10,
+	"mibps": 8 << 20,
+	"gibps": 8 << 30,
+	"tibps": 8 << 40,
+}
+
+// burstUnits maps the units accepted by ParseBurst to their value in bytes.
+var burstUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"ki":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mi":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gi":  1 << 30,
+	"gib": 1 << 30,
+}
+
+// splitQuantity splits s into a non-negative number and its unit.
+func splitQuantity(s string) (float64, string, error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	v, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid number in %q", s)
+	}
+	return v, s[i:], nil
+}
+
+// ParseBandwidth parses a rate and returns it in bytes per second. The rate
+// is either a Kubernetes quantity of bits per second, e.g. "10M" or "1Gi", or
+// a rate with a tc unit, e.g. "100mbit" or "1mbps". Zero means unlimited.
+func ParseBandwidth(s string) (uint64, error) {
+	v, unit, err := splitQuantity(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth: %v", err)
+	}
+	mult, ok := bandwidthUnits[unit]
+	if !ok {
+		// tc units are case-insensitive.
+		mult, ok = bandwidthUnits[strings.ToLower(unit)]
+	}
+	if !ok {
+		return 0, fmt.Errorf("invalid bandwidth %q: unknown unit %q", s, unit)
+	}
+	return uint64(v * mult / 8), nil
+}
+
+// ParseBurst parses a burst size and returns it in bytes, e.g. "64kb" or
+// "1Mi". Units are multiples of 1024 bytes as in tc.
+func ParseBurst(s string) (uint64, error) {
+	v, unit, err := splitQuantity(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid burst: %v", err)
+	}
+	mult, ok := burstUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("invalid burst %q: unknown unit %q", s, unit)
+	}
+	return uint64(v * mult), nil
+}
+
+// ParseBandwidthLimit parses the rate and burst of a bandwidth limit. burst
+// may be empty for the default burst.
+func ParseBandwidthLimit(rate, burst string) (shaper.Limit, error) {
+	var (
+		limit shaper.Limit
+		err   error
+	)
+	if limit.Rate, err = ParseBandwidth(rate); err != nil {
+		return shaper.Limit{}, err
+	}
+	if burst != "" {
+		if limit.Burst, err = ParseBurst(burst); err != nil {
+			return shaper.Limit{}, err
+		}
+	}
+	return limit, nil
+}
+
+// BandwidthLimits returns the bandwidth limits of the external interfaces of
+// the sandbox requested by the spec's annotations.
+func BandwidthLimits(spec *specs.Spec) (shaper.Limits, error) {
+	var limits shaper.Limits
+	for _, dir := range []struct {
+		limit             *shaper.Limit
+		rateKey, burstKey string
+	}{
+		{&limits.Ingress, ingressBandwidthAnnotation, ingressBurstAnnotation},
+		{&limits.Egress, egressBandwidthAnnotation, egressBurstAnnotation},
+	} {
+		rate, ok := spec.Annotations[dir.rateKey]
+		if !ok {
+			if _, ok := spec.Annotations[dir.burstKey]; ok {
+				return shaper.Limits{}, fmt.Errorf("%s annotation requires %s", dir.burstKey, dir.rateKey)
+			}
+			continue
+		}
+		limit, err := ParseBandwidthLimit(rate, spec.Annotations[dir.burstKey])
+		if err != nil {
+			return shaper.Limits{}, fmt.Errorf("invalid %s annotation: %w", dir.rateKey, err)
+		}
+		*dir.limit = limit
+	}
+	if limits != (shaper.Limits{}) {
+		log.Infof("Bandwidth annotations found: %+v", limits)
+	}
+	return limits, nil
+}
+
+// SetBandwidthArgs are arguments to SetBandwidth.
+type SetBandwidthArgs struct {
+	// Ingress and Egress are the new limits of each direction. The limit of
+	// a direction is not changed if nil.
+	Ingress *shaper.Limit
+	Egress  *shaper.Limit
+}
+
+// SetBandwidth changes the bandwidth limits of the external interfaces of the
+// sandbox, i.e. the fd-based NICs. Packets that are queued are sent at the new
+// rates.
+func (n *Network) SetBandwidth(args *SetBandwidthArgs, _ *struct{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	found := false
+	for _, info := range n.Stack.NICInfo() {
+		nic, ok := info.Context.(*fdbasedNIC)
+		if !ok {
+			continue
+		}
+		limits := nic.shaper.Limits()
+		if args.Ingress != nil {
+			limits.Ingress = *args.Ingress
+		}
+		if args.Egress != nil {
+			limits.Egress = *args.Egress
+		}
+		log.Infof("Setting bandwidth limits of interface %q to %+v", info.Name, limits)
+		nic.shaper.SetLimits(limits)
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("sandbox has no external interface")
+	}
+	return nil
+}
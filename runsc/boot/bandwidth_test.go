@@ -0,0 +1,156 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/tcpip/link/shaper"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want uint64
+	}{
+		{in: "0", want: 0},
+		{in: "8000", want: 1000},
+		{in: "10M", want: 1250000},
+		{in: "1Gi", want: 1 << 27},
+		{in: "100mbit", want: 12500000},
+		{in: "100Mbit", want: 12500000},
+		{in: "1.5kbit", want: 187},
+		{in: "1mbps", want: 1000000},
+		{in: "1kibps", want: 1024},
+	} {
+		got, err := ParseBandwidth(tc.in)
+		if err != nil {
+			t.Errorf("ParseBandwidth(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseBandwidth(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseBandwidthInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"mbit",
+		"-1mbit",
+		"10m",
+		"10 mbit",
+		"1e6",
+		"10mb",
+	} {
+		if got, err := ParseBandwidth(in); err == nil {
+			t.Errorf("ParseBandwidth(%q) = %d, want error", in, got)
+		}
+	}
+}
+
+func TestParseBurst(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want uint64
+	}{
+		{in: "1500", want: 1500},
+		{in: "1500b", want: 1500},
+		{in: "64kb", want: 64 << 10},
+		{in: "64K", want: 64 << 10},
+		{in: "1Mi", want: 1 << 20},
+		{in: "1g", want: 1 << 30},
+	} {
+		got, err := ParseBurst(tc.in)
+		if err != nil {
+			t.Errorf("ParseBurst(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseBurst(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+	for _, in := range []string{"", "kb", "1kbit"} {
+		if got, err := ParseBurst(in); err == nil {
+			t.Errorf("ParseBurst(%q) = %d, want error", in, got)
+		}
+	}
+}
+
+func TestBandwidthLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		want        shaper.Limits
+		wantErr     bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "kubernetes",
+			annotations: map[string]string{
+				ingressBandwidthAnnotation: "10M",
+				egressBandwidthAnnotation:  "1G",
+			},
+			want: shaper.Limits{
+				Ingress: shaper.Limit{Rate: 1250000},
+				Egress:  shaper.Limit{Rate: 125000000},
+			},
+		},
+		{
+			name: "burst",
+			annotations: map[string]string{
+				egressBandwidthAnnotation: "100mbit",
+				egressBurstAnnotation:     "256kb",
+			},
+			want: shaper.Limits{
+				Egress: shaper.Limit{Rate: 12500000, Burst: 256 << 10},
+			},
+		},
+		{
+			name: "burst without rate",
+			annotations: map[string]string{
+				ingressBurstAnnotation: "256kb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid rate",
+			annotations: map[string]string{
+				ingressBandwidthAnnotation: "fast",
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := BandwidthLimits(&specs.Spec{Annotations: tc.annotations})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("BandwidthLimits() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BandwidthLimits() failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("BandwidthLimits() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -92,28 +92,10 @@ func (c *compatEmitter) emitUnimplementedSyscall(us *spb.UnimplementedSyscall) {
 	sysnr := syscallNum(regs)
 	tr := c.trackers[sysnr]
 	if tr == nil {
-		switch sysnr {
-		case unix.SYS_PRCTL:
-			// args: cmd, ...
-			tr = newArgsTracker(0)
-
-		case unix.SYS_IOCTL, unix.SYS_EPOLL_CTL, unix.SYS_SHMCTL, unix.SYS_FUTEX, unix.SYS_FALLOCATE:
-			// args: fd/addr, cmd, ...
-			tr = newArgsTracker(1)
-
-		case unix.SYS_GETSOCKOPT, unix.SYS_SETSOCKOPT:
-			// args: fd, level, name, ...
-			tr = newArgsTracker(1, 2)
-
-		case unix.SYS_SEMCTL:
-			// args: semid, semnum, cmd, ...
-			tr = newArgsTracker(2)
-
-		default:
-			tr = newArchArgsTracker(sysnr)
-			if tr == nil {
-				tr = &onceTracker{}
-			}
+		if idx := syscallVariantArgs(sysnr); idx != nil {
+			tr = newArgsTracker(idx...)
+		} else {
+			tr = &onceTracker{}
 		}
 		c.trackers[sysnr] = tr
 	}
@@ -143,6 +125,30 @@ func (c *compatEmitter) Close() error {
 	return nil
 }
 
+// syscallVariantArgs returns the indices of the arguments of the given
+// syscall that select between different operations, e.g. the ioctl request,
+// or nil if the syscall has a single variant.
+func syscallVariantArgs(sysnr uint64) []int {
+	switch sysnr {
+	case unix.SYS_PRCTL:
+		// args: cmd, ...
+		return []int{0}
+
+	case unix.SYS_IOCTL, unix.SYS_EPOLL_CTL, unix.SYS_SHMCTL, unix.SYS_FUTEX, unix.SYS_FALLOCATE:
+		// args: fd/addr, cmd, ...
+		return []int{1}
+
+	case unix.SYS_GETSOCKOPT, unix.SYS_SETSOCKOPT:
+		// args: fd, level, name, ...
+		return []int{1, 2}
+
+	case unix.SYS_SEMCTL:
+		// args: semid, semnum, cmd, ...
+		return []int{2}
+	}
+	return archSyscallVariantArgs(sysnr)
+}
+
 // syscallTracker interface allows filters to apply differently depending on
 // the syscall and arguments.
 type syscallTracker interface {
@@ -90,11 +90,17 @@ func syscallNum(regs *rpb.Registers) uint64 {
 	return amd64Regs.OrigRax
 }
 
-func newArchArgsTracker(sysnr uint64) syscallTracker {
+func archSyscallVariantArgs(sysnr uint64) []int {
 	switch sysnr {
 	case unix.SYS_ARCH_PRCTL:
 		// args: cmd, ...
-		return newArgsTracker(0)
+		return []int{0}
 	}
 	return nil
 }
+
+// frameRegs returns the instruction and frame pointers.
+func frameRegs(regs *rpb.Registers) (ip, fp uint64) {
+	amd64Regs := regs.GetArch().(*rpb.Registers_Amd64).Amd64
+	return amd64Regs.Rip, amd64Regs.Rbp
+}
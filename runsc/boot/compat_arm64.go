@@ -89,7 +89,13 @@ func syscallNum(regs *rpb.Registers) uint64 {
 	return arm64Regs.R8
 }
 
-func newArchArgsTracker(sysnr uint64) syscallTracker {
+func archSyscallVariantArgs(sysnr uint64) []int {
 	// currently, no arch specific syscalls need to be handled here.
 	return nil
 }
+
+// frameRegs returns the instruction and frame pointers.
+func frameRegs(regs *rpb.Registers) (ip, fp uint64) {
+	arm64Regs := regs.GetArch().(*rpb.Registers_Arm64).Arm64
+	return arm64Regs.Pc, arm64Regs.R29
+}
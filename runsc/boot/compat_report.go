@@ -0,0 +1,304 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/hostarch"
+	rpb "gvisor.dev/gvisor/pkg/sentry/arch/registers_go_proto"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/strace"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	// maxStackFrames is the maximum number of frames recorded for the first
+	// invocation of each unimplemented syscall.
+	maxStackFrames = 32
+
+	// maxArgv0Len is the maximum length of the recorded argv[0].
+	maxArgv0Len = 256
+)
+
+// CompatPolicy is the format of the file passed in the --compat-policy flag.
+type CompatPolicy struct {
+	// Kill lists the unimplemented syscalls that kill the calling process
+	// with SIGSYS.
+	Kill []CompatPolicyRule `json:"kill"`
+}
+
+// CompatPolicyRule matches invocations of an unimplemented syscall.
+type CompatPolicyRule struct {
+	// Syscall is the name of the syscall, e.g. "ioctl".
+	Syscall string `json:"syscall"`
+
+	// Args, if set, restricts the rule to the given values of the syscall's
+	// variant arguments, e.g. the ioctl request or the getsockopt level and
+	// name. If not set, the rule matches all variants.
+	Args []uint64 `json:"args,omitempty"`
+}
+
+// CompatReport is a summary of the unimplemented syscalls invoked in the
+// sandbox, as collected with --compat-tracking.
+type CompatReport struct {
+	// Syscalls contains one entry for each unimplemented syscall variant,
+	// sorted by decreasing count.
+	Syscalls []CompatReportEntry `json:"syscalls"`
+}
+
+// CompatReportEntry describes an unimplemented syscall variant.
+type CompatReportEntry struct {
+	// Syscall is the name of the syscall.
+	Syscall string `json:"syscall"`
+
+	// Number is the syscall number.
+	Number uint64 `json:"number"`
+
+	// Variant maps the syscall's variant arguments, e.g. "arg1" for the
+	// ioctl request, to their value. It is empty for syscalls with a single
+	// variant.
+	Variant map[string]string `json:"variant,omitempty"`
+
+	// Count is the number of times the variant was invoked.
+	Count uint64 `json:"count"`
+
+	// Killed is true if invocations of the variant are killed by the
+	// --compat-policy.
+	Killed bool `json:"killed,omitempty"`
+
+	// FirstSeen describes the first invocation of the variant.
+	FirstSeen CompatInvocation `json:"first_seen"`
+}
+
+// CompatInvocation describes an invocation of an unimplemented syscall.
+type CompatInvocation struct {
+	// Argv0 is the first argument of the calling process.
+	Argv0 string `json:"argv0"`
+
+	// PID and TID are the calling thread group and thread IDs in the root
+	// PID namespace.
+	PID int32 `json:"pid"`
+	TID int32 `json:"tid"`
+
+	// Stack is the application's stack at the time of the call, starting
+	// with the instruction pointer. Return addresses are found by walking
+	// frame pointers, so the stack is truncated if the application doesn't
+	// maintain them.
+	Stack []string `json:"stack"`
+}
+
+// compatKey identifies an unimplemented syscall variant.
+type compatKey struct {
+	sysnr   uint64
+	variant string
+}
+
+// compatTracker implements kernel.UnimplementedSyscallObserver by counting
+// every unimplemented syscall invocation, and killing the ones that match its
+// policy.
+type compatTracker struct {
+	nameMap strace.SyscallMap
+
+	// tracking is true if invocations are counted.
+	tracking bool
+
+	// kill is the set of variant keys of killed syscalls, indexed by syscall
+	// number. An empty key matches all variants. kill is immutable.
+	kill map[uint64]map[string]struct{}
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// entries maps each invoked variant to its report entry.
+	entries map[compatKey]*CompatReportEntry
+}
+
+// newCompatTracker returns a compatTracker that counts invocations if
+// tracking is set, and enforces the policy read from policyFD if it is
+// non-negative. It returns nil if there is nothing to track or enforce.
+func newCompatTracker(tracking bool, policyFD int) (*compatTracker, error) {
+	if !tracking && policyFD < 0 {
+		return nil, nil
+	}
+	nameMap, ok := getSyscallNameMap()
+	if !ok {
+		return nil, fmt.Errorf("syscall table not found")
+	}
+	c := &compatTracker{
+		nameMap:  nameMap,
+		tracking: tracking,
+		kill:     make(map[uint64]map[string]struct{}),
+		entries:  make(map[compatKey]*CompatReportEntry),
+	}
+	if policyFD >= 0 {
+		f := os.NewFile(uintptr(policyFD), "compat policy file")
+		defer f.Close()
+		var policy CompatPolicy
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&policy); err != nil {
+			return nil, fmt.Errorf("parsing compat policy: %w", err)
+		}
+		for _, rule := range policy.Kill {
+			sysnr, ok := nameMap.ConvertToSysno(rule.Syscall)
+			if !ok {
+				return nil, fmt.Errorf("compat policy: unknown syscall %q", rule.Syscall)
+			}
+			var key string
+			if len(rule.Args) > 0 {
+				idx := syscallVariantArgs(uint64(sysnr))
+				if len(rule.Args) != len(idx) {
+					return nil, fmt.Errorf("compat policy: syscall %q has %d variant arguments, got %d", rule.Syscall, len(idx), len(rule.Args))
+				}
+				key = variantKey(rule.Args)
+			}
+			if c.kill[uint64(sysnr)] == nil {
+				c.kill[uint64(sysnr)] = make(map[string]struct{})
+			}
+			c.kill[uint64(sysnr)][key] = struct{}{}
+		}
+	}
+	return c, nil
+}
+
+// variantKey returns the key identifying a syscall variant.
+func variantKey(vals []uint64) string {
+	var buf bytes.Buffer
+	for _, v := range vals {
+		fmt.Fprintf(&buf, "%d|", v)
+	}
+	return buf.String()
+}
+
+// ObserveUnimplementedSyscall implements
+// kernel.UnimplementedSyscallObserver.ObserveUnimplementedSyscall.
+func (c *compatTracker) ObserveUnimplementedSyscall(t *kernel.Task, regs *rpb.Registers) bool {
+	sysnr := syscallNum(regs)
+	idx := syscallVariantArgs(sysnr)
+	vals := make([]uint64, 0, len(idx))
+	for _, i := range idx {
+		vals = append(vals, argVal(i, regs))
+	}
+	key := variantKey(vals)
+
+	kill := false
+	if keys, ok := c.kill[sysnr]; ok {
+		_, all := keys[""]
+		_, match := keys[key]
+		kill = all || match
+	}
+
+	if c.tracking {
+		c.mu.Lock()
+		e := c.entries[compatKey{sysnr, key}]
+		if e == nil {
+			e = &CompatReportEntry{
+				Syscall:   c.nameMap.Name(uintptr(sysnr)),
+				Number:    sysnr,
+				Killed:    kill,
+				FirstSeen: newCompatInvocation(t, regs),
+			}
+			if len(idx) > 0 {
+				e.Variant = make(map[string]string, len(idx))
+				for i, argIdx := range idx {
+					e.Variant[fmt.Sprintf("arg%d", argIdx)] = fmt.Sprintf("%#x", vals[i])
+				}
+			}
+			c.entries[compatKey{sysnr, key}] = e
+		}
+		e.Count++
+		c.mu.Unlock()
+	}
+	return kill
+}
+
+// newCompatInvocation describes the current syscall invocation of t.
+func newCompatInvocation(t *kernel.Task, regs *rpb.Registers) CompatInvocation {
+	pidns := t.Kernel().TaskSet().Root
+	inv := CompatInvocation{
+		Argv0: taskArgv0(t),
+		PID:   int32(pidns.IDOfThreadGroup(t.ThreadGroup())),
+		TID:   int32(pidns.IDOfTask(t)),
+	}
+	ip, fp := frameRegs(regs)
+	inv.Stack = append(inv.Stack, fmt.Sprintf("%#x", ip))
+	var frame [16]byte
+	for len(inv.Stack) < maxStackFrames && fp != 0 && fp%8 == 0 {
+		// Each frame starts with the caller's frame pointer, followed by
+		// the return address.
+		if _, err := t.CopyInBytes(hostarch.Addr(fp), frame[:]); err != nil {
+			break
+		}
+		next := hostarch.ByteOrder.Uint64(frame[:8])
+		ret := hostarch.ByteOrder.Uint64(frame[8:])
+		if ret == 0 {
+			break
+		}
+		inv.Stack = append(inv.Stack, fmt.Sprintf("%#x", ret))
+		if next <= fp {
+			// Stacks grow down, so callers' frames are at higher addresses.
+			break
+		}
+		fp = next
+	}
+	return inv
+}
+
+// taskArgv0 returns the first argument of t's process.
+func taskArgv0(t *kernel.Task) string {
+	m := t.MemoryManager()
+	if m == nil {
+		return ""
+	}
+	var buf [maxArgv0Len]byte
+	argv := buf[:]
+	if n := int(m.ArgvEnd() - m.ArgvStart()); n >= 0 && n < len(argv) {
+		argv = argv[:n]
+	}
+	n, _ := m.CopyIn(t, m.ArgvStart(), argv, usermem.IOOpts{IgnorePermissions: true})
+	argv = argv[:n]
+	if i := bytes.IndexByte(argv, 0); i >= 0 {
+		argv = argv[:i]
+	}
+	return string(argv)
+}
+
+// report returns a snapshot of the invocations counted so far.
+func (c *compatTracker) report() *CompatReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := &CompatReport{Syscalls: make([]CompatReportEntry, 0, len(c.entries))}
+	for _, e := range c.entries {
+		r.Syscalls = append(r.Syscalls, *e)
+	}
+	sort.Slice(r.Syscalls, func(i, j int) bool {
+		a, b := &r.Syscalls[i], &r.Syscalls[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		return fmt.Sprint(a.Variant) < fmt.Sprint(b.Variant)
+	})
+	return r
+}
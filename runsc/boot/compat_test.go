@@ -15,7 +15,10 @@
 package boot
 
 import (
+	"os"
 	"testing"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestOnceTracker(t *testing.T) {
@@ -88,3 +91,64 @@ func TestArgsTrackerLimit(t *testing.T) {
 		t.Error("shouldReport after limit was reached, got: true, want: false")
 	}
 }
+
+// compatPolicyFD returns a file descriptor to a compat policy file.
+func compatPolicyFD(t *testing.T, policy string) int {
+	f, err := os.CreateTemp(t.TempDir(), "compat-policy")
+	if err != nil {
+		t.Fatalf("CreateTemp failed: %v", err)
+	}
+	if _, err := f.WriteString(policy); err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	defer f.Close()
+	// newCompatTracker takes ownership of the returned FD.
+	fd, err := unix.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("Dup failed: %v", err)
+	}
+	return fd
+}
+
+func TestCompatPolicy(t *testing.T) {
+	nameMap, ok := getSyscallNameMap()
+	if !ok {
+		t.Fatalf("syscall table not found")
+	}
+	// The registers returned by newRegs invoke syscall 0.
+	name := nameMap.Name(0)
+
+	for _, tc := range []struct {
+		name    string
+		policy  string
+		wantErr bool
+		want    bool
+	}{
+		{name: "empty", policy: `{}`, want: false},
+		{name: "kill", policy: `{"kill": [{"syscall": "` + name + `"}]}`, want: true},
+		{name: "other syscall", policy: `{"kill": [{"syscall": "ioctl"}]}`, want: false},
+		{name: "unknown syscall", policy: `{"kill": [{"syscall": "foo"}]}`, wantErr: true},
+		{name: "unknown field", policy: `{"deny": []}`, wantErr: true},
+		{name: "bad args", policy: `{"kill": [{"syscall": "ioctl", "args": [1, 2]}]}`, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := newCompatTracker(false /* tracking */, compatPolicyFD(t, tc.policy))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("newCompatTracker succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newCompatTracker failed: %v", err)
+			}
+			// The task is only used when tracking is enabled.
+			if got := c.ObserveUnimplementedSyscall(nil, newRegs()); got != tc.want {
+				t.Errorf("ObserveUnimplementedSyscall got: %t, want: %t", got, tc.want)
+			}
+		})
+	}
+}
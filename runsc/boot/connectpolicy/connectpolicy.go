@@ -0,0 +1,237 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connectpolicy implements a stack.TCPConnectHook that asks an
+// external policy server whether TCP connections are allowed.
+//
+// The protocol is described in connect_policy.proto.
+package connectpolicy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	pb "gvisor.dev/gvisor/runsc/boot/connectpolicy/connect_policy_go_proto"
+)
+
+// DefaultTimeout is the time that connections wait for a verdict before they
+// are denied.
+const DefaultTimeout = time.Second
+
+// maxMessageSize is the largest message accepted from the policy server.
+const maxMessageSize = 64 << 10
+
+// lengthSize is the size of the length prefix of each message.
+const lengthSize = 4
+
+// Client is a connection to a policy server. Its Hook method can be installed
+// with stack.Stack.SetTCPConnectHook.
+//
+// Connections are denied if the policy server doesn't reply in time or the
+// connection to it fails.
+type Client struct {
+	conn    io.ReadWriteCloser
+	timeout time.Duration
+
+	// writeMu serializes writes to conn.
+	writeMu sync.Mutex
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// nextID is the id of the next request.
+	nextID uint64
+
+	// pending maps the ids of requests that are waiting for a reply to the
+	// channel that the reply is sent to.
+	pending map[uint64]chan *pb.ConnectResponse
+
+	// err is the error that broke the connection to the policy server, if
+	// any.
+	err error
+}
+
+// New returns a client that sends requests over conn, which must be connected
+// to a policy server. The client takes ownership of conn.
+func New(conn io.ReadWriteCloser, timeout time.Duration) *Client {
+	c := &Client{
+		conn:    conn,
+		timeout: timeout,
+		pending: make(map[uint64]chan *pb.ConnectResponse),
+	}
+	go c.readLoop() // S/R-SAFE: clients are recreated by the loader on restore.
+	return c
+}
+
+// Close closes the connection to the policy server. Subsequent connections are
+// denied.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Hook implements stack.TCPConnectHook.
+func (c *Client) Hook(req stack.TCPConnectRequest) stack.TCPConnectDecision {
+	deny := stack.TCPConnectDecision{Verdict: stack.TCPConnectDeny}
+
+	msg := &pb.ConnectRequest{
+		LocalAddr:  []byte(req.ID.LocalAddress),
+		LocalPort:  uint32(req.ID.LocalPort),
+		RemoteAddr: []byte(req.ID.RemoteAddress),
+		RemotePort: uint32(req.ID.RemotePort),
+	}
+	switch req.NetProto {
+	case header.IPv4ProtocolNumber:
+		msg.Family = linux.AF_INET
+	case header.IPv6ProtocolNumber:
+		msg.Family = linux.AF_INET6
+	}
+	if req.Owner != nil {
+		msg.Uid = req.Owner.KUID()
+		msg.Gid = req.Owner.KGID()
+		if o, ok := req.Owner.(interface{ ContainerID() string }); ok {
+			msg.ContainerId = o.ContainerID()
+		}
+	}
+
+	ch := make(chan *pb.ConnectResponse, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return deny
+	}
+	msg.Id = c.nextID
+	c.nextID++
+	c.pending[msg.Id] = ch
+	c.mu.Unlock()
+
+	if err := c.send(msg); err != nil {
+		log.Warningf("Failed to send connect policy request: %v", err)
+		c.cancel(msg.Id)
+		return deny
+	}
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		if resp == nil {
+			return deny
+		}
+		return decision(resp, len(req.ID.RemoteAddress))
+	case <-timer.C:
+		log.Warningf("Connect policy request %d timed out, denying connection", msg.Id)
+		c.cancel(msg.Id)
+		return deny
+	}
+}
+
+// decision converts resp to a stack.TCPConnectDecision.
+func decision(resp *pb.ConnectResponse, addrLen int) stack.TCPConnectDecision {
+	switch resp.GetVerdict() {
+	case pb.ConnectResponse_ALLOW:
+		return stack.TCPConnectDecision{Verdict: stack.TCPConnectAllow}
+	case pb.ConnectResponse_REDIRECT:
+		if len(resp.GetRedirectAddr()) != addrLen || resp.GetRedirectPort() > 0xffff {
+			log.Warningf("Invalid connect policy redirect to %v:%d, denying connection", resp.GetRedirectAddr(), resp.GetRedirectPort())
+			break
+		}
+		return stack.TCPConnectDecision{
+			Verdict: stack.TCPConnectRedirect,
+			Redirect: tcpip.FullAddress{
+				Addr: tcpip.Address(resp.GetRedirectAddr()),
+				Port: uint16(resp.GetRedirectPort()),
+			},
+		}
+	}
+	return stack.TCPConnectDecision{Verdict: stack.TCPConnectDeny}
+}
+
+// send writes msg to the policy server.
+func (c *Client) send(msg *pb.ConnectRequest) error {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, lengthSize+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[lengthSize:], payload)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.conn.Write(buf)
+	return err
+}
+
+// cancel stops waiting for a reply to the request with the given id.
+func (c *Client) cancel(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// readLoop receives replies from the policy server and dispatches them to the
+// requests that are waiting for them, until the connection fails.
+func (c *Client) readLoop() {
+	err := c.readReplies()
+	log.Warningf("Connection to connect policy server failed, denying all connections: %v", err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) readReplies() error {
+	var lenBuf [lengthSize]byte
+	for {
+		if _, err := io.ReadFull(c.conn, lenBuf[:]); err != nil {
+			return err
+		}
+		size := binary.LittleEndian.Uint32(lenBuf[:])
+		if size > maxMessageSize {
+			return fmt.Errorf("message too large: %d bytes", size)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(c.conn, payload); err != nil {
+			return err
+		}
+		resp := &pb.ConnectResponse{}
+		if err := proto.Unmarshal(payload, resp); err != nil {
+			return fmt.Errorf("invalid response: %w", err)
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.GetId()]
+		delete(c.pending, resp.GetId())
+		c.mu.Unlock()
+		if !ok {
+			// The request timed out.
+			log.Debugf("Dropping connect policy response to unknown request %d", resp.GetId())
+			continue
+		}
+		ch <- resp
+	}
+}
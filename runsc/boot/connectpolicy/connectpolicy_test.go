@@ -0,0 +1,196 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectpolicy
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	pb "gvisor.dev/gvisor/runsc/boot/connectpolicy/connect_policy_go_proto"
+)
+
+type owner struct{}
+
+func (owner) KUID() uint32        { return 1000 }
+func (owner) KGID() uint32        { return 2000 }
+func (owner) ContainerID() string { return "container" }
+
+func readRequest(conn net.Conn) (*pb.ConnectRequest, error) {
+	var lenBuf [lengthSize]byte
+	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, err
+	}
+	req := &pb.ConnectRequest{}
+	if err := proto.Unmarshal(payload, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func writeResponse(conn net.Conn, resp *pb.ConnectResponse) error {
+	payload, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, lengthSize, lengthSize+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	_, err = conn.Write(append(buf, payload...))
+	return err
+}
+
+func connectRequest(port uint16) stack.TCPConnectRequest {
+	return stack.TCPConnectRequest{
+		NetProto: header.IPv4ProtocolNumber,
+		ID: stack.TransportEndpointID{
+			LocalAddress:  "\x0a\x00\x00\x01",
+			RemoteAddress: "\x0a\x00\x00\x02",
+			RemotePort:    port,
+		},
+		Owner: owner{},
+	}
+}
+
+func TestHook(t *testing.T) {
+	redirect := tcpip.FullAddress{Addr: "\x0a\x00\x00\x03", Port: 3128}
+	for _, test := range []struct {
+		name string
+		resp *pb.ConnectResponse
+		want stack.TCPConnectDecision
+	}{
+		{
+			name: "Allow",
+			resp: &pb.ConnectResponse{Verdict: pb.ConnectResponse_ALLOW},
+			want: stack.TCPConnectDecision{Verdict: stack.TCPConnectAllow},
+		},
+		{
+			name: "Deny",
+			resp: &pb.ConnectResponse{Verdict: pb.ConnectResponse_DENY},
+			want: stack.TCPConnectDecision{Verdict: stack.TCPConnectDeny},
+		},
+		{
+			name: "Redirect",
+			resp: &pb.ConnectResponse{
+				Verdict:      pb.ConnectResponse_REDIRECT,
+				RedirectAddr: []byte(redirect.Addr),
+				RedirectPort: uint32(redirect.Port),
+			},
+			want: stack.TCPConnectDecision{Verdict: stack.TCPConnectRedirect, Redirect: redirect},
+		},
+		{
+			name: "RedirectWrongFamily",
+			resp: &pb.ConnectResponse{
+				Verdict:      pb.ConnectResponse_REDIRECT,
+				RedirectAddr: make([]byte, header.IPv6AddressSize),
+				RedirectPort: uint32(redirect.Port),
+			},
+			want: stack.TCPConnectDecision{Verdict: stack.TCPConnectDeny},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			c := New(client, time.Minute)
+			defer c.Close()
+
+			go func() {
+				req, err := readRequest(server)
+				if err != nil {
+					t.Errorf("readRequest: %v", err)
+					return
+				}
+				if req.GetContainerId() != "container" || req.GetUid() != 1000 || req.GetGid() != 2000 || req.GetRemotePort() != 80 {
+					t.Errorf("got request %v, want container ID, credentials and port of the connection", req)
+				}
+				test.resp.Id = req.GetId()
+				if err := writeResponse(server, test.resp); err != nil {
+					t.Errorf("writeResponse: %v", err)
+				}
+			}()
+			if got := c.Hook(connectRequest(80)); got != test.want {
+				t.Errorf("Hook() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHookOutOfOrder(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	c := New(client, time.Minute)
+	defer c.Close()
+
+	// Allow the connection to port 80 and deny the one to port 81, replying to
+	// them in reverse order.
+	go func() {
+		var reqs []*pb.ConnectRequest
+		for len(reqs) < 2 {
+			req, err := readRequest(server)
+			if err != nil {
+				t.Errorf("readRequest: %v", err)
+				return
+			}
+			reqs = append(reqs, req)
+		}
+		for i := len(reqs) - 1; i >= 0; i-- {
+			verdict := pb.ConnectResponse_DENY
+			if reqs[i].GetRemotePort() == 80 {
+				verdict = pb.ConnectResponse_ALLOW
+			}
+			if err := writeResponse(server, &pb.ConnectResponse{Id: reqs[i].GetId(), Verdict: verdict}); err != nil {
+				t.Errorf("writeResponse: %v", err)
+			}
+		}
+	}()
+
+	results := make(chan stack.TCPConnectVerdict, 1)
+	go func() {
+		results <- c.Hook(connectRequest(81)).Verdict
+	}()
+	if got := c.Hook(connectRequest(80)).Verdict; got != stack.TCPConnectAllow {
+		t.Errorf("got verdict %d for port 80, want %d", got, stack.TCPConnectAllow)
+	}
+	if got := <-results; got != stack.TCPConnectDeny {
+		t.Errorf("got verdict %d for port 81, want %d", got, stack.TCPConnectDeny)
+	}
+}
+
+func TestHookFailure(t *testing.T) {
+	client, server := net.Pipe()
+	c := New(client, 10*time.Millisecond)
+	defer c.Close()
+
+	// The server doesn't reply in time.
+	go readRequest(server)
+	if got := c.Hook(connectRequest(80)).Verdict; got != stack.TCPConnectDeny {
+		t.Errorf("got verdict %d after timeout, want %d", got, stack.TCPConnectDeny)
+	}
+
+	// The server goes away.
+	server.Close()
+	if got := c.Hook(connectRequest(80)).Verdict; got != stack.TCPConnectDeny {
+		t.Errorf("got verdict %d after server closed, want %d", got, stack.TCPConnectDeny)
+	}
+}
@@ -22,15 +22,18 @@ import (
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/control/server"
 	"gvisor.dev/gvisor/pkg/fd"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/seccheck"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
 	"gvisor.dev/gvisor/pkg/sentry/state"
-	"gvisor.dev/gvisor/pkg/sentry/time"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
@@ -55,12 +58,26 @@ const (
 	// ContMgrEvent gets stats about the container used by "runsc events".
 	ContMgrEvent = "containerManager.Event"
 
+	// ContMgrKillAll sends a signal to all processes in a container, then
+	// kills any that don't exit within a timeout.
+	ContMgrKillAll = "containerManager.KillAll"
+
 	// ContMgrExecuteAsync executes a command in a container.
 	ContMgrExecuteAsync = "containerManager.ExecuteAsync"
 
 	// ContMgrProcesses lists processes running in a container.
 	ContMgrProcesses = "containerManager.Processes"
 
+	// ContMgrResize changes the number of CPUs and the total memory of the
+	// sandbox.
+	ContMgrResize = "containerManager.Resize"
+
+	// ContMgrResizeTTY sets the window size of a container process' TTY.
+	ContMgrResizeTTY = "containerManager.ResizeTTY"
+
+	// ContMgrMigrate migrates a sandbox to another host.
+	ContMgrMigrate = "containerManager.Migrate"
+
 	// ContMgrRestore restores a container from a statefile.
 	ContMgrRestore = "containerManager.Restore"
 
@@ -92,14 +109,62 @@ const (
 
 	// ContMgrProcfsDump dumps sandbox procfs state.
 	ContMgrProcfsDump = "containerManager.ProcfsDump"
+
+	// ContMgrFDsDump dumps the FD tables, mounts and working directories of
+	// all tasks in the sandbox.
+	ContMgrFDsDump = "containerManager.FDsDump"
+
+	// ContMgrSetRealtimeOffset sets the offset of the sandbox's
+	// CLOCK_REALTIME from the host's.
+	ContMgrSetRealtimeOffset = "containerManager.SetRealtimeOffset"
+
+	// ContMgrAdvanceTime advances the sandbox's virtual time.
+	ContMgrAdvanceTime = "containerManager.AdvanceTime"
+
+	// ContMgrCopyIn copies files from the host into a container.
+	ContMgrCopyIn = "containerManager.CopyIn"
+
+	// ContMgrCopyOut copies files from a container to the host.
+	ContMgrCopyOut = "containerManager.CopyOut"
+
+	// ContMgrSetIOLimits changes the file I/O limits of a container.
+	ContMgrSetIOLimits = "containerManager.SetIOLimits"
+
+	// ContMgrReconnectGofer reconnects a container's filesystems to a new
+	// gofer.
+	ContMgrReconnectGofer = "containerManager.ReconnectGofer"
 )
 
 const (
 	// NetworkCreateLinksAndRoutes creates links and routes in a network stack.
 	NetworkCreateLinksAndRoutes = "Network.CreateLinksAndRoutes"
 
+	// NetworkStats dumps the counters and state of the network stack.
+	NetworkStats = "Network.Stats"
+
+	// NetworkConnTrack dumps the connection tracking table of the network
+	// stack.
+	NetworkConnTrack = "Network.ConnTrack"
+
+	// NetworkAttachNIC adds an interface to a running network stack.
+	NetworkAttachNIC = "Network.AttachNIC"
+
+	// NetworkDetachNIC removes an interface from a running network stack.
+	NetworkDetachNIC = "Network.DetachNIC"
+
+	// NetworkSetBandwidth changes the bandwidth limits of the external
+	// interfaces of a running network stack.
+	NetworkSetBandwidth = "Network.SetBandwidth"
+
 	// DebugStacks collects sandbox stacks for debugging.
 	DebugStacks = "debug.Stacks"
+
+	// DebugMetrics exports a snapshot of sandbox metrics.
+	DebugMetrics = "debug.Metrics"
+
+	// DebugCompatReport reports the unimplemented syscalls invoked in the
+	// sandbox.
+	DebugCompatReport = "debug.CompatReport"
 )
 
 // Profiling related commands (see pprof.go for more details).
@@ -114,6 +179,12 @@ const (
 // Logging related commands (see logging.go for more details).
 const (
 	LoggingChange = "Logging.Change"
+
+	// LoggingDump writes the recent log statements retained by the sentry.
+	LoggingDump = "Logging.Dump"
+
+	// LoggingFollow streams log statements as the sentry emits them.
+	LoggingFollow = "Logging.Follow"
 )
 
 // Lifecycle related commands (see lifecycle.go for more details).
@@ -124,9 +195,10 @@ const (
 
 // Usage related commands (see usage.go for more details).
 const (
-	UsageCollect = "Usage.Collect"
-	UsageUsageFD = "Usage.UsageFD"
-	UsageReduce  = "Usage.Reduce"
+	UsageCollect         = "Usage.Collect"
+	UsageUsageFD         = "Usage.UsageFD"
+	UsageReduce          = "Usage.Reduce"
+	UsageMemoryBreakdown = "Usage.MemoryBreakdown"
 )
 
 // Commands for interacting with cgroupfs within the sandbox.
@@ -169,14 +241,14 @@ func newController(fd int, l *Loader) (*controller, error) {
 	ctrl.srv.Register(ctrl.manager)
 	ctrl.srv.Register(&control.Cgroups{Kernel: l.k})
 	ctrl.srv.Register(&control.Lifecycle{Kernel: l.k})
-	ctrl.srv.Register(&control.Logging{})
+	ctrl.srv.Register(&control.Logging{Ring: l.logRing})
 	ctrl.srv.Register(&control.Proc{Kernel: l.k})
 	ctrl.srv.Register(&control.State{Kernel: l.k})
 	ctrl.srv.Register(&control.Usage{Kernel: l.k})
-	ctrl.srv.Register(&debug{})
+	ctrl.srv.Register(&debug{metrics: l.metricExporter, compat: l.compat})
 
 	if eps, ok := l.k.RootNetworkNamespace().Stack().(*netstack.Stack); ok {
-		ctrl.srv.Register(&Network{Stack: eps.Stack})
+		ctrl.srv.Register(&Network{Stack: eps.Stack, Kernel: l.k, dhcp: &l.dhcp})
 	}
 	if l.root.conf.ProfileEnable {
 		ctrl.srv.Register(control.NewProfile(l.k))
@@ -364,12 +436,40 @@ func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 	return state.Save(o, nil)
 }
 
+// Migrate migrates a sandbox to a destination accepting a live migration.
+func (cm *containerManager) Migrate(o *control.MigrateOpts, stats *state.MigrationStats) error {
+	log.Debugf("containerManager.Migrate")
+	// TODO(gvisor.dev/issues/6243): save/restore not supported w/ hostinet
+	if cm.l.root.conf.Network == config.NetworkHost {
+		return errors.New("migration not supported when using hostinet")
+	}
+
+	state := control.State{
+		Kernel:   cm.l.k,
+		Watchdog: cm.l.watchdog,
+	}
+	return state.Migrate(o, stats)
+}
+
 // RestoreOpts contains options related to restoring a container's file system.
 type RestoreOpts struct {
 	// FilePayload contains the state file to be restored, followed by the
-	// platform device file if necessary.
+	// pages file if HavePagesFile is set, followed by the platform device
+	// file if necessary.
 	urpc.FilePayload
 
+	// HavePagesFile indicates that the contents of memory were saved to a
+	// separate pages file.
+	HavePagesFile bool
+
+	// LazyPages indicates that the contents of memory should be loaded from
+	// the pages file on demand.
+	LazyPages bool
+
+	// EncryptionKey, if set, is the key that the state file was encrypted
+	// with.
+	EncryptionKey []byte
+
 	// SandboxID contains the ID of the sandbox.
 	SandboxID string
 }
@@ -381,23 +481,66 @@ type RestoreOpts struct {
 func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Restore")
 
-	var specFile, deviceFile *os.File
-	switch numFiles := len(o.Files); numFiles {
-	case 2:
+	if len(o.Files) == 0 {
+		return fmt.Errorf("at least one file must be passed to Restore")
+	}
+	specFile := o.Files[0]
+	files := o.Files[1:]
+
+	var pagesFile *os.File
+	if o.HavePagesFile {
+		if len(files) == 0 {
+			return fmt.Errorf("pages file must be passed to Restore")
+		}
+		// The pages file is donated to the MemoryFile, which may keep using
+		// it after Restore returns. Dup it to get a new FD, like the device
+		// file below.
+		fd, err := unix.Dup(int(files[0].Fd()))
+		if err != nil {
+			return fmt.Errorf("failed to dup file: %v", err)
+		}
+		pagesFile = os.NewFile(uintptr(fd), "pages file")
+		files = files[1:]
+	} else if o.LazyPages {
+		return fmt.Errorf("lazy pages requires a pages file")
+	}
+
+	var deviceFile *os.File
+	switch len(files) {
+	case 1:
 		// The device file is donated to the platform.
 		// Can't take ownership away from os.File. dup them to get a new FD.
-		fd, err := unix.Dup(int(o.Files[1].Fd()))
+		fd, err := unix.Dup(int(files[0].Fd()))
 		if err != nil {
+			if pagesFile != nil {
+				pagesFile.Close()
+			}
 			return fmt.Errorf("failed to dup file: %v", err)
 		}
 		deviceFile = os.NewFile(uintptr(fd), "platform device")
-		fallthrough
-	case 1:
-		specFile = o.Files[0]
 	case 0:
-		return fmt.Errorf("at least one file must be passed to Restore")
 	default:
-		return fmt.Errorf("at most two files may be passed to Restore")
+		if pagesFile != nil {
+			pagesFile.Close()
+		}
+		return fmt.Errorf("too many files passed to Restore")
+	}
+	loadOpts := state.LoadOpts{
+		Source:        specFile,
+		PagesFile:     pagesFile,
+		LazyPages:     o.LazyPages,
+		EncryptionKey: o.EncryptionKey,
+	}
+
+	netmaskRewrites, err := parseNetmaskRewrites(cm.l.root.conf.NetmaskRewrite)
+	if err != nil {
+		if pagesFile != nil {
+			pagesFile.Close()
+		}
+		if deviceFile != nil {
+			deviceFile.Close()
+		}
+		return err
 	}
 
 	// Pause the kernel while we build a new one.
@@ -410,7 +553,7 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	k := &kernel.Kernel{
 		Platform: p,
 	}
-	mf, err := createMemoryFile()
+	mf, err := createMemoryFile(cm.l.root.conf, cm.l.swapFile)
 	if err != nil {
 		return fmt.Errorf("creating memory file: %v", err)
 	}
@@ -421,7 +564,7 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	// Set up the restore environment.
 	ctx := k.SupervisorContext()
 	mntr := newContainerMounter(&cm.l.root, cm.l.k, cm.l.mountHints, cm.l.productName)
-	ctx, err = mntr.configureRestore(ctx)
+	ctx, err = mntr.configureRestore(ctx, cm.l.root.conf)
 	if err != nil {
 		return fmt.Errorf("configuring filesystem restore: %v", err)
 	}
@@ -429,12 +572,14 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	// Prepare to load from the state file.
 	if eps, ok := networkStack.(*netstack.Stack); ok {
 		stack.StackFromEnv = eps.Stack // FIXME(b/36201077)
+		eps.Stack.SetRestoreSubnetRewrites(netmaskRewrites)
 	}
+	// The state file may also be a pipe or a socket, whose size is unknown.
 	info, err := specFile.Stat()
 	if err != nil {
 		return err
 	}
-	if info.Size() == 0 {
+	if info.Mode().IsRegular() && info.Size() == 0 {
 		return fmt.Errorf("file cannot be empty")
 	}
 
@@ -450,21 +595,25 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	}
 
 	// Load the state.
-	loadOpts := state.LoadOpts{Source: specFile}
-	if err := loadOpts.Load(ctx, k, nil, networkStack, time.NewCalibratedClocks(), &vfs.CompleteRestoreOptions{}); err != nil {
+	if err := loadOpts.Load(ctx, k, nil, networkStack, createClocks(cm.l.root.conf), &vfs.CompleteRestoreOptions{}); err != nil {
 		return err
 	}
+	k.Timekeeper().SetVirtualTimeQuantum(cm.l.root.conf.VirtualTimeQuantum)
+
+	if cm.l.compat != nil {
+		k.SetUnimplementedSyscallObserver(cm.l.compat)
+	}
 
 	// Since we have a new kernel we also must make a new watchdog.
-	dogOpts := watchdog.DefaultOpts
-	dogOpts.TaskTimeoutAction = cm.l.root.conf.WatchdogAction
-	dog := watchdog.New(k, dogOpts)
+	dog := watchdog.New(k, watchdogOpts(cm.l.root.conf, k, cm.l.watchdogBundle, cm.l.watchdogLog))
 
 	// Change the loader fields to reflect the changes made when restoring.
 	cm.l.k = k
 	cm.l.watchdog = dog
 	cm.l.root.procArgs = kernel.CreateProcessArgs{}
 	cm.l.restore = true
+	cm.l.enableOOMKiller()
+	cm.l.k.EnableCacheShrinker(cm.l.totalMem)
 
 	// Reinitialize the sandbox ID and processes map. Note that it doesn't
 	// restore the state of multiple containers, nor exec processes.
@@ -488,13 +637,27 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 }
 
 // Wait waits for the init process in the given container.
-func (cm *containerManager) Wait(cid *string, waitStatus *uint32) error {
-	log.Debugf("containerManager.Wait, cid: %s", *cid)
-	err := cm.l.waitContainer(*cid, waitStatus)
-	log.Debugf("containerManager.Wait returned, cid: %s, waitStatus: %#x, err: %v", *cid, *waitStatus, err)
+func (cm *containerManager) Wait(args *WaitArgs, waitStatus *uint32) error {
+	log.Debugf("containerManager.Wait, cid: %s, timeout: %v", args.CID, args.Timeout)
+	err := cm.l.waitContainer(args.CID, args.Timeout, waitStatus)
+	log.Debugf("containerManager.Wait returned, cid: %s, waitStatus: %#x, err: %v", args.CID, *waitStatus, err)
 	return err
 }
 
+// ErrWaitTimeout is returned by Wait and WaitPID when the process doesn't exit
+// before the timeout expires.
+var ErrWaitTimeout = errors.New("timed out waiting for process to exit")
+
+// WaitArgs are arguments to the Wait method.
+type WaitArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Timeout is the maximum time to wait for the process to exit. If it is
+	// 0, Wait waits indefinitely.
+	Timeout gtime.Duration
+}
+
 // WaitPIDArgs are arguments to the WaitPID method.
 type WaitPIDArgs struct {
 	// PID is the PID in the container's PID namespace.
@@ -502,12 +665,16 @@ type WaitPIDArgs struct {
 
 	// CID is the container ID.
 	CID string
+
+	// Timeout is the maximum time to wait for the process to exit. If it is
+	// 0, WaitPID waits indefinitely.
+	Timeout gtime.Duration
 }
 
 // WaitPID waits for the process with PID 'pid' in the sandbox.
 func (cm *containerManager) WaitPID(args *WaitPIDArgs, waitStatus *uint32) error {
-	log.Debugf("containerManager.Wait, cid: %s, pid: %d", args.CID, args.PID)
-	err := cm.l.waitPID(kernel.ThreadID(args.PID), args.CID, waitStatus)
+	log.Debugf("containerManager.Wait, cid: %s, pid: %d, timeout: %v", args.CID, args.PID, args.Timeout)
+	err := cm.l.waitPID(kernel.ThreadID(args.PID), args.CID, args.Timeout, waitStatus)
 	log.Debugf("containerManager.Wait, cid: %s, pid: %d, waitStatus: %#x, err: %v", args.CID, args.PID, *waitStatus, err)
 	return err
 }
@@ -571,6 +738,120 @@ func (cm *containerManager) Signal(args *SignalArgs, _ *struct{}) error {
 	return cm.l.signal(args.CID, args.PID, args.Signo, args.Mode)
 }
 
+// ResizeTTYArgs are arguments to the ResizeTTY method.
+type ResizeTTYArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the process ID in the given container whose TTY is resized,
+	// relative to the root PID namespace, not the container's. If 0, the TTY
+	// of the container init process is resized.
+	PID int32
+
+	// Winsize is the new window size.
+	Winsize linux.Winsize
+}
+
+// ResizeTTY sets the window size of the TTY attached to a process in a
+// container. If the size changed, the foreground process group of the TTY is
+// sent SIGWINCH.
+func (cm *containerManager) ResizeTTY(args *ResizeTTYArgs, _ *struct{}) error {
+	log.Debugf("containerManager.ResizeTTY: cid: %s, PID: %d, rows: %d, cols: %d", args.CID, args.PID, args.Winsize.Row, args.Winsize.Col)
+	if args.PID < 0 {
+		return fmt.Errorf("PID (%d) must be positive", args.PID)
+	}
+	if err := cm.l.resizeTTY(args.CID, kernel.ThreadID(args.PID), &args.Winsize); err != nil {
+		return fmt.Errorf("resizing TTY in container %q PID %d: %w", args.CID, args.PID, err)
+	}
+	return nil
+}
+
+// ResizeArgs are arguments to the Resize method.
+type ResizeArgs struct {
+	// CPUs is the new number of CPUs visible to the sandbox. If 0, the
+	// number of CPUs is left unchanged.
+	CPUs uint
+
+	// TotalMem is the new total memory in bytes reported to the sandbox. If
+	// 0, the total memory is left unchanged.
+	TotalMem uint64
+}
+
+// Resize changes the number of CPUs and the total memory of the sandbox, as
+// seen by applications in /proc, /sys, sched_getaffinity(2) and sysinfo(2).
+func (cm *containerManager) Resize(args *ResizeArgs, _ *struct{}) error {
+	log.Debugf("containerManager.Resize: CPUs: %d, total memory: %d", args.CPUs, args.TotalMem)
+	return cm.l.resize(args.CPUs, args.TotalMem)
+}
+
+// SetIOLimitsArgs are arguments to the SetIOLimits method.
+type SetIOLimitsArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Limits are the new file I/O limits of the container.
+	Limits usage.IOLimits
+}
+
+// SetIOLimits changes the file I/O limits of a container. I/O in progress is
+// not affected.
+func (cm *containerManager) SetIOLimits(args *SetIOLimitsArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetIOLimits: cid: %s, limits: %+v", args.CID, args.Limits)
+	if _, err := cm.l.threadGroupFromID(execID{cid: args.CID}); err != nil {
+		return err
+	}
+	cm.l.k.ContainerIO(args.CID).SetLimits(args.Limits)
+	return nil
+}
+
+// ReconnectGoferArgs are arguments to the ReconnectGofer method.
+type ReconnectGoferArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// FilePayload contains the FDs connected to the new gofer, in the same
+	// order as the gofer FDs that the container was started with.
+	urpc.FilePayload
+}
+
+// ReconnectGofer reconnects the filesystems of a container whose gofer died
+// to a new gofer. It requires config.Config.GoferReconnectTimeout to be set.
+func (cm *containerManager) ReconnectGofer(args *ReconnectGoferArgs, _ *struct{}) error {
+	log.Debugf("containerManager.ReconnectGofer: cid: %s, files: %d", args.CID, len(args.Files))
+	if len(args.Files) == 0 {
+		return fmt.Errorf("reconnect arguments must contain at least one gofer file")
+	}
+	goferFDs, err := fd.NewFromFiles(args.Files)
+	if err != nil {
+		return fmt.Errorf("error dup'ing gofer files: %w", err)
+	}
+	return cm.l.reconnectGofer(args.CID, goferFDs)
+}
+
+// KillAllArgs are arguments to the KillAll method.
+type KillAllArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Signo is the signal to send to all processes in the container first.
+	Signo int32
+
+	// Timeout is the time to wait for all processes to exit after Signo is
+	// sent, before any remaining processes are sent SIGKILL.
+	Timeout gtime.Duration
+}
+
+// KillAll sends args.Signo to all processes in a container and waits up to
+// args.Timeout for them to exit. Processes that are still alive after the
+// timeout, including those created in the meantime, are sent SIGKILL. forced
+// is set to true if SIGKILL had to be sent.
+func (cm *containerManager) KillAll(args *KillAllArgs, forced *bool) error {
+	log.Debugf("containerManager.KillAll: cid: %s, signal: %d, timeout: %v", args.CID, args.Signo, args.Timeout)
+	var err error
+	*forced, err = cm.l.killAllProcesses(args.CID, args.Signo, args.Timeout)
+	return err
+}
+
 // CreateTraceSessionArgs are arguments to the CreateTraceSession method.
 type CreateTraceSessionArgs struct {
 	Config seccheck.SessionConfig
@@ -593,10 +874,16 @@ func (cm *containerManager) CreateTraceSession(args *CreateTraceSessionArgs, _ *
 	return seccheck.Create(&args.Config, args.Force)
 }
 
-// DeleteTraceSession deletes an existing trace session.
-func (cm *containerManager) DeleteTraceSession(name *string, _ *struct{}) error {
+// DeleteTraceSession deletes an existing trace session and returns its final
+// status.
+func (cm *containerManager) DeleteTraceSession(name *string, out *seccheck.SessionConfig) error {
 	log.Debugf("containerManager.DeleteTraceSession: name: %q", *name)
-	return seccheck.Delete(*name)
+	session, err := seccheck.Delete(*name)
+	if err != nil {
+		return err
+	}
+	*out = session
+	return nil
 }
 
 // ListTraceSessions lists trace sessions.
@@ -623,3 +910,140 @@ func (cm *containerManager) ProcfsDump(_ *struct{}, out *[]procfs.ProcessProcfsD
 	}
 	return nil
 }
+
+// FDsDumpOpts contains the arguments to FDsDump.
+type FDsDumpOpts struct {
+	// FilePayload contains the file that the dump is written to.
+	urpc.FilePayload
+}
+
+// FDsDump writes the FD tables, mount tables, working directory and root
+// directory of every task in the sandbox to the donated file, as a stream of
+// JSON objects. See procfs.DumpFDs.
+func (cm *containerManager) FDsDump(o *FDsDumpOpts, _ *struct{}) error {
+	log.Debugf("containerManager.FDsDump")
+	if len(o.Files) != 1 {
+		return fmt.Errorf("FDsDump requires exactly one output file, got %d", len(o.Files))
+	}
+	out := o.Files[0]
+	defer out.Close()
+	return procfs.DumpFDs(out, cm.l.k)
+}
+
+// SetRealtimeOffsetArgs are arguments to the SetRealtimeOffset method.
+type SetRealtimeOffsetArgs struct {
+	// Offset is the new offset of the sandbox's CLOCK_REALTIME from the
+	// host's.
+	Offset gtime.Duration
+}
+
+// SetRealtimeOffset changes CLOCK_REALTIME as seen by applications in the
+// sandbox, without changing the host's clock. Timers armed against
+// CLOCK_REALTIME are reevaluated against the new time.
+func (cm *containerManager) SetRealtimeOffset(args *SetRealtimeOffsetArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetRealtimeOffset: %v", args.Offset)
+	cm.l.k.Timekeeper().SetRealtimeOffset(args.Offset)
+	return nil
+}
+
+// idleSettleTime is how long the sandbox must remain idle for AdvanceTime to
+// consider it idle, so that tasks woken by one another get to run.
+const idleSettleTime = 10 * gtime.Millisecond
+
+// AdvanceTimeArgs are arguments to the AdvanceTime method.
+type AdvanceTimeArgs struct {
+	// Delta is the amount by which to advance virtual time. It is ignored if
+	// NextTimer is set.
+	Delta gtime.Duration
+
+	// NextTimer advances virtual time to the earliest timer deadline instead
+	// of by Delta.
+	NextTimer bool
+
+	// WaitIdle makes AdvanceTime wait for the sandbox to be idle before
+	// advancing time, so that tasks run until they block, and again before
+	// returning, so that the effects of the advance are visible.
+	WaitIdle bool
+
+	// IdleTimeout is the maximum time to wait for the sandbox to be idle with
+	// WaitIdle. 0 waits forever.
+	IdleTimeout gtime.Duration
+}
+
+// AdvanceTime advances the sandbox's virtual time, firing the timers that
+// expire in the meantime in deadline order, and returns the new
+// CLOCK_MONOTONIC time. It requires the sandbox to use virtual time.
+func (cm *containerManager) AdvanceTime(args *AdvanceTimeArgs, now *gtime.Duration) error {
+	log.Debugf("containerManager.AdvanceTime: %+v", args)
+	tk := cm.l.k.Timekeeper()
+	if !tk.IsVirtual() {
+		return kernel.ErrNotVirtualTime
+	}
+	if args.WaitIdle {
+		if err := cm.l.k.WaitIdle(idleSettleTime, args.IdleTimeout); err != nil {
+			return err
+		}
+	}
+	if args.NextTimer {
+		t, ok, err := tk.AdvanceToNextTimer()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Infof("No timer is set, virtual time didn't advance")
+		}
+		*now = gtime.Duration(t.Nanoseconds())
+	} else {
+		t, err := tk.AdvanceTime(args.Delta)
+		if err != nil {
+			return err
+		}
+		*now = gtime.Duration(t.Nanoseconds())
+	}
+	if args.WaitIdle {
+		return cm.l.k.WaitIdle(idleSettleTime, args.IdleTimeout)
+	}
+	return nil
+}
+
+// CopyArgs contains the arguments to CopyIn and CopyOut.
+type CopyArgs struct {
+	// ContainerID is the container whose mount namespace and credentials are
+	// used to resolve Path.
+	ContainerID string
+
+	// Path is the path of the file or directory in the container.
+	Path string
+
+	// FilePayload contains the file that the tar stream of copied files is
+	// read from or written to.
+	urpc.FilePayload
+}
+
+// CopyIn extracts the tar stream read from the donated file to args.Path in
+// the container. See control.CopyIn.
+func (cm *containerManager) CopyIn(args *CopyArgs, _ *struct{}) error {
+	log.Debugf("containerManager.CopyIn, cid: %s, path: %q", args.ContainerID, args.Path)
+	if len(args.Files) != 1 {
+		return fmt.Errorf("CopyIn requires exactly one input file, got %d", len(args.Files))
+	}
+	in := args.Files[0]
+	defer in.Close()
+	return cm.l.copyContainerFiles(args.ContainerID, func(ctx context.Context, creds *auth.Credentials, root vfs.VirtualDentry) error {
+		return control.CopyIn(ctx, creds, root, args.Path, in)
+	})
+}
+
+// CopyOut writes args.Path in the container to the donated file as a tar
+// stream. See control.CopyOut.
+func (cm *containerManager) CopyOut(args *CopyArgs, _ *struct{}) error {
+	log.Debugf("containerManager.CopyOut, cid: %s, path: %q", args.ContainerID, args.Path)
+	if len(args.Files) != 1 {
+		return fmt.Errorf("CopyOut requires exactly one output file, got %d", len(args.Files))
+	}
+	out := args.Files[0]
+	defer out.Close()
+	return cm.l.copyContainerFiles(args.ContainerID, func(ctx context.Context, creds *auth.Credentials, root vfs.VirtualDentry) error {
+		return control.CopyOut(ctx, creds, root, args.Path, out)
+	})
+}
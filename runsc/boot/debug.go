@@ -15,10 +15,19 @@
 package boot
 
 import (
+	"bytes"
+	"fmt"
+
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
 )
 
 type debug struct {
+	// metrics exports sandbox metrics.
+	metrics *metric.PrometheusExporter
+
+	// compat counts unimplemented syscalls. It may be nil.
+	compat *compatTracker
 }
 
 // Stacks collects all sandbox stacks and copies them to 'stacks'.
@@ -27,3 +36,23 @@ func (*debug) Stacks(_ *struct{}, stacks *string) error {
 	*stacks = string(buf)
 	return nil
 }
+
+// Metrics exports a snapshot of all sandbox metrics in the Prometheus text
+// exposition format to 'metrics'.
+func (d *debug) Metrics(_ *struct{}, metrics *string) error {
+	var buf bytes.Buffer
+	if err := d.metrics.Export(&buf); err != nil {
+		return err
+	}
+	*metrics = buf.String()
+	return nil
+}
+
+// CompatReport reports the unimplemented syscalls invoked in the sandbox.
+func (d *debug) CompatReport(_ *struct{}, report *CompatReport) error {
+	if d.compat == nil || !d.compat.tracking {
+		return fmt.Errorf("compat tracking is disabled, see --compat-tracking")
+	}
+	*report = *d.compat.report()
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/dhcp"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// dhcpRetransmission is the initial timeout for replies to DHCP requests.
+const dhcpRetransmission = 4 * time.Second
+
+// dhcpLeases records the network configuration leased with DHCP for the
+// sandbox's interfaces.
+type dhcpLeases struct {
+	mu sync.Mutex
+
+	// configs maps the names of interfaces with a lease to its
+	// configuration.
+	//
+	// +checklocks:mu
+	configs map[string]dhcp.Config
+}
+
+// set records cfg as the configuration leased for the interface with the
+// given name. If cfg is nil, the interface has no lease.
+func (l *dhcpLeases) set(name string, cfg *dhcp.Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cfg == nil {
+		delete(l.configs, name)
+		return
+	}
+	if l.configs == nil {
+		l.configs = make(map[string]dhcp.Config)
+	}
+	l.configs[name] = *cfg
+}
+
+// resolvConf returns the contents of a resolv.conf(5) listing the DNS servers
+// and domain names of the current leases, or "" if there are no leases.
+func (l *dhcpLeases) resolvConf() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.configs) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(l.configs))
+	for name := range l.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# Generated by runsc from DHCP leases.\n")
+	var domains []string
+	for _, name := range names {
+		cfg := l.configs[name]
+		for _, dns := range cfg.DNS {
+			fmt.Fprintf(&b, "nameserver %s\n", dns)
+		}
+		if cfg.DomainName != "" {
+			domains = append(domains, cfg.DomainName)
+		}
+	}
+	if len(domains) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(domains, " "))
+	}
+	return b.String()
+}
+
+// dhcpLink installs the addresses and routes leased with DHCP for a NIC.
+type dhcpLink struct {
+	n        *Network
+	name     string
+	nicID    tcpip.NICID
+	linkAddr tcpip.LinkAddress
+
+	// addr and routes are the address and routes installed for the current
+	// lease. They are only accessed by leaseChanged, which the DHCP client
+	// never calls concurrently.
+	addr   tcpip.AddressWithPrefix
+	routes []tcpip.Route
+}
+
+// startDHCP leases addresses for links with DHCP, and keeps renewing the
+// leases in the background. It returns an error if any link doesn't get a
+// lease within timeout.
+func (n *Network) startDHCP(links []*dhcpLink, timeout time.Duration) error {
+	if len(links) == 0 {
+		return nil
+	}
+	if n.dhcp == nil {
+		n.dhcp = &dhcpLeases{}
+	}
+	for _, link := range links {
+		c := dhcp.NewClient(n.Stack, link.nicID, link.linkAddr, dhcpRetransmission, link.leaseChanged)
+		log.Infof("Leasing an address with DHCP for interface %q", link.name)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		_, err := c.Acquire(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("leasing an address with DHCP for interface %q: %w", link.name, err)
+		}
+		go c.Run(context.Background())
+	}
+	return nil
+}
+
+// leaseChanged implements dhcp.AcquiredFunc.
+func (l *dhcpLink) leaseChanged(lost, acquired tcpip.AddressWithPrefix, cfg dhcp.Config) {
+	if l.addr.Address != "" && l.addr != acquired {
+		if acquired.Address == "" {
+			log.Warningf("DHCP lease of %s for interface %q was lost! The address is removed, and the interface is unusable until a new lease is acquired.", l.addr, l.name)
+		} else {
+			log.Warningf("DHCP lease for interface %q changed from %s to %s, connections using the old address will break", l.name, l.addr, acquired)
+		}
+		l.uninstall()
+	}
+	if acquired.Address == "" {
+		l.n.dhcp.set(l.name, nil)
+		return
+	}
+	if l.addr != acquired {
+		if err := l.install(acquired, &cfg); err != nil {
+			log.Warningf("Installing DHCP lease for interface %q: %v", l.name, err)
+			return
+		}
+	}
+	l.n.dhcp.set(l.name, &cfg)
+}
+
+// install adds addr and the routes in cfg to the link's NIC, and notifies the
+// sandboxed application of the new address.
+func (l *dhcpLink) install(addr tcpip.AddressWithPrefix, cfg *dhcp.Config) error {
+	l.n.mu.Lock()
+	defer l.n.mu.Unlock()
+
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          ipv4.ProtocolNumber,
+		AddressWithPrefix: addr,
+	}
+	if err := l.n.Stack.AddProtocolAddress(l.nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+		return fmt.Errorf("adding address %s: %s", addr, err)
+	}
+	l.addr = addr
+	l.routes = []tcpip.Route{{Destination: addr.Subnet(), NIC: l.nicID}}
+	if len(cfg.Routers) > 0 {
+		l.routes = append(l.routes, tcpip.Route{
+			Destination: header.IPv4EmptySubnet,
+			Gateway:     cfg.Routers[0],
+			NIC:         l.nicID,
+		})
+	}
+	log.Infof("Leased %s with DHCP for interface %q, adding routes %+v, DNS servers: %v", addr, l.name, l.routes, cfg.DNS)
+	l.n.Stack.SetRouteTable(insertRoutes(l.n.Stack.GetRouteTable(), l.routes))
+
+	if s := l.n.inetStack(); s != nil {
+		inet.NotifyInterfaceAddrAdded(s, int32(l.nicID), dhcpInterfaceAddr(addr))
+	}
+	return nil
+}
+
+// uninstall removes the installed address and routes from the link's NIC, and
+// notifies the sandboxed application of the removed address.
+func (l *dhcpLink) uninstall() {
+	l.n.mu.Lock()
+	defer l.n.mu.Unlock()
+
+	if err := l.n.Stack.RemoveAddress(l.nicID, l.addr.Address); err != nil {
+		log.Warningf("Removing address %s from interface %q: %s", l.addr, l.name, err)
+	}
+	routes := l.routes
+	l.n.Stack.RemoveRoutes(func(r tcpip.Route) bool {
+		for _, route := range routes {
+			if r.Equal(route) {
+				return true
+			}
+		}
+		return false
+	})
+
+	if s := l.n.inetStack(); s != nil {
+		inet.NotifyInterfaceAddrRemoved(s, int32(l.nicID), dhcpInterfaceAddr(l.addr))
+	}
+	l.addr = tcpip.AddressWithPrefix{}
+	l.routes = nil
+}
+
+// dhcpInterfaceAddr returns the inet.InterfaceAddr for an address leased with
+// DHCP.
+func dhcpInterfaceAddr(addr tcpip.AddressWithPrefix) inet.InterfaceAddr {
+	return inet.InterfaceAddr{
+		Family:    linux.AF_INET,
+		PrefixLen: uint8(addr.PrefixLen),
+		Addr:      []byte(addr.Address),
+	}
+}
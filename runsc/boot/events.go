@@ -15,7 +15,10 @@
 package boot
 
 import (
+	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 )
 
@@ -33,14 +36,60 @@ type Event struct {
 	Type string `json:"type"`
 	ID   string `json:"id"`
 	Data Stats  `json:"data"`
+
+	// State is the new container status. It's only set for events of type
+	// "state", which are emitted by "runsc events --stream" when the
+	// container status changes.
+	State string `json:"state,omitempty"`
 }
 
 // Stats is the runc specific stats structure for stability when encoding and
 // decoding stats.
 type Stats struct {
-	CPU    CPU    `json:"cpu"`
-	Memory Memory `json:"memory"`
-	Pids   Pids   `json:"pids"`
+	CPU               CPU                 `json:"cpu"`
+	Memory            Memory              `json:"memory"`
+	Pids              Pids                `json:"pids"`
+	NetworkInterfaces []*NetworkInterface `json:"network_interfaces,omitempty"`
+	IO                IO                  `json:"io"`
+}
+
+// IO contains stats on file I/O, in the style of cgroup v2 io.stat. Only I/O
+// to regular files is accounted.
+type IO struct {
+	// Usage contains the I/O performed by each file system kind, "gofer"
+	// for files backed by the host and "tmpfs" for files backed by sandbox
+	// memory.
+	Usage []*IOEntry `json:"usage,omitempty"`
+
+	// ThrottledUsec is the total time that I/O has been delayed by Limits,
+	// in microseconds.
+	ThrottledUsec uint64 `json:"throttled_usec"`
+
+	// Limits are the limits applied to the container's I/O, in the style of
+	// cgroup v2 io.max. It's only set for a single container.
+	Limits *usage.IOLimits `json:"limits,omitempty"`
+}
+
+// IOEntry contains stats on the file I/O of one file system kind.
+type IOEntry struct {
+	Source string `json:"source"`
+	usage.IOStat
+}
+
+// NetworkInterface contains stats on a network interface. Counters are
+// cumulative since the interface was created.
+type NetworkInterface struct {
+	// Name is the name of the network interface.
+	Name string `json:"name"`
+
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
 }
 
 // Pids contains stats on processes.
@@ -65,6 +114,10 @@ type Memory struct {
 	Kernel    MemoryEntry       `json:"kernel,omitempty"`
 	KernelTCP MemoryEntry       `json:"kernelTCP,omitempty"`
 	Raw       map[string]uint64 `json:"raw,omitempty"`
+
+	// OOMKills is the number of processes in the container killed by the
+	// sentry's OOM killer (see --oom-policy=kill).
+	OOMKills uint64 `json:"oomKills,omitempty"`
 }
 
 // CPU contains stats on the CPU.
@@ -80,8 +133,10 @@ type CPUUsage struct {
 	PerCPU []uint64 `json:"percpu,omitempty"`
 }
 
-// Event gets the events from the container.
-func (cm *containerManager) Event(_ *struct{}, out *EventOut) error {
+// Event gets the events from the container. cid may be nil, in which case
+// network stats are reported for the root network namespace and I/O stats are
+// reported for the whole sandbox.
+func (cm *containerManager) Event(cid *string, out *EventOut) error {
 	*out = EventOut{
 		Event: Event{
 			Type: "stats",
@@ -96,6 +151,12 @@ func (cm *containerManager) Event(_ *struct{}, out *EventOut) error {
 	out.Event.Data.Memory.Usage = MemoryEntry{
 		Usage: totalUsage,
 	}
+	if limit, _ := mem.Limit(); limit != 0 {
+		out.Event.Data.Memory.Usage.Limit = limit
+	}
+	if cid != nil {
+		out.Event.Data.Memory.OOMKills = cm.l.k.OOMKills(*cid)
+	}
 
 	// PIDs.
 	// TODO(gvisor.dev/issue/172): Per-container accounting.
@@ -104,5 +165,64 @@ func (cm *containerManager) Event(_ *struct{}, out *EventOut) error {
 	// CPU usage by container.
 	out.ContainerUsage = control.ContainerUsage(cm.l.k)
 
+	// Network usage, from the network namespace the container is in.
+	var id string
+	if cid != nil {
+		id = *cid
+	}
+	out.Event.Data.NetworkInterfaces = networkStats(cm.l.containerNetworkStack(id))
+
+	// File I/O, per container or for the whole sandbox.
+	out.Event.Data.IO = ioStats(cm.l.k, cid)
+
 	return nil
 }
+
+// networkStats returns the stats of all interfaces in stack.
+func networkStats(stack inet.Stack) []*NetworkInterface {
+	if stack == nil {
+		return nil
+	}
+	var ifaces []*NetworkInterface
+	for _, iface := range stack.Interfaces() {
+		var stats inet.StatDev
+		if err := stack.Statistics(&stats, iface.Name); err != nil {
+			log.Warningf("Failed to retrieve interface statistics for %q: %v", iface.Name, err)
+			continue
+		}
+		ifaces = append(ifaces, &NetworkInterface{
+			Name:      iface.Name,
+			RxBytes:   stats[0],
+			RxPackets: stats[1],
+			RxErrors:  stats[2],
+			RxDropped: stats[3],
+			TxBytes:   stats[8],
+			TxPackets: stats[9],
+			TxErrors:  stats[10],
+			TxDropped: stats[11],
+		})
+	}
+	return ifaces
+}
+
+// containerNetworkStack returns the network stack of the network namespace
+// that the init process of container cid is in. It falls back to the root
+// network namespace if the container can't be found or has stopped.
+func (l *Loader) containerNetworkStack(cid string) inet.Stack {
+	root := l.k.RootNetworkNamespace().Stack()
+	if cid == "" {
+		return root
+	}
+	tg, err := l.threadGroupFromID(execID{cid: cid})
+	if err != nil {
+		return root
+	}
+	leader := tg.Leader()
+	if leader == nil || leader.ExitState() != kernel.TaskExitNone {
+		return root
+	}
+	if netns := leader.NetworkNamespace(); netns != nil {
+		return netns.Stack()
+	}
+	return root
+}
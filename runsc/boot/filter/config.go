@@ -51,11 +51,38 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.EqualTo(0),
 			seccomp.EqualTo(0),
 		},
+		// Used by fdbased to create the stop FDs of NICs attached to a
+		// running sandbox, and to convert sentry eventfds to host eventfds
+		// that are passed to host peers.
+		{
+			seccomp.EqualTo(0),
+			seccomp.EqualTo(linux.EFD_NONBLOCK),
+		},
+		{
+			seccomp.EqualTo(0),
+			seccomp.EqualTo(linux.EFD_NONBLOCK | linux.EFD_SEMAPHORE),
+		},
 	},
 	unix.SYS_EXIT:       {},
 	unix.SYS_EXIT_GROUP: {},
-	unix.SYS_FALLOCATE:  {},
-	unix.SYS_FCHMOD:     {},
+	// Used by the gofer client to read ahead from and drop the page cache of
+	// host FDs.
+	unix.SYS_FADVISE64: []seccomp.Rule{
+		{
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FADV_WILLNEED),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FADV_DONTNEED),
+		},
+	},
+	unix.SYS_FALLOCATE: {},
+	unix.SYS_FCHMOD:    {},
 	unix.SYS_FCNTL: []seccomp.Rule{
 		{
 			seccomp.MatchAny{},
@@ -110,6 +137,9 @@ var allowedSyscalls = seccomp.SyscallRules{
 	},
 	unix.SYS_GETPID:    {},
 	unix.SYS_GETRANDOM: {},
+	// Used by fdbased to find the type of the sockets of NICs attached to a
+	// running sandbox.
+	unix.SYS_GETSOCKNAME: {},
 	unix.SYS_GETSOCKOPT: []seccomp.Rule{
 		{
 			seccomp.MatchAny{},
@@ -287,6 +317,15 @@ var allowedSyscalls = seccomp.SyscallRules{
 		},
 	},
 	unix.SYS_SETITIMER: {},
+	unix.SYS_SETSOCKOPT: []seccomp.Rule{
+		// Used by fdbased to set up the sockets of NICs attached to a
+		// running sandbox.
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.SOL_PACKET),
+			seccomp.EqualTo(unix.PACKET_FANOUT),
+		},
+	},
 	unix.SYS_SHUTDOWN: []seccomp.Rule{
 		// Used by fs/host to shutdown host sockets.
 		{seccomp.MatchAny{}, seccomp.EqualTo(unix.SHUT_RD)},
@@ -771,3 +810,115 @@ func controlServerFilters(fd int) seccomp.SyscallRules {
 		},
 	}
 }
+
+// directfsFilters returns syscalls made by the gofer filesystem client to
+// access files directly with host FDs donated by the gofer.
+func directfsFilters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_FSTATFS:    {},
+		unix.SYS_GETDENTS64: {},
+		unix.SYS_OPENAT: []seccomp.Rule{
+			{
+				seccomp.MatchAny{},
+				seccomp.MatchAny{},
+				seccomp.EqualTo(unix.O_PATH | unix.O_NOFOLLOW | unix.O_CLOEXEC | unix.O_LARGEFILE),
+			},
+			{
+				seccomp.MatchAny{},
+				seccomp.MatchAny{},
+				seccomp.EqualTo(unix.O_RDONLY | unix.O_NONBLOCK | unix.O_CLOEXEC | unix.O_LARGEFILE),
+			},
+			{
+				seccomp.MatchAny{},
+				seccomp.MatchAny{},
+				seccomp.EqualTo(unix.O_RDONLY | unix.O_DIRECTORY | unix.O_CLOEXEC | unix.O_LARGEFILE),
+			},
+		},
+		unix.SYS_READLINKAT: {},
+	}
+}
+
+// procSelfFDFilters returns syscalls made to identify the type of host FDs
+// imported with SCM_RIGHTS, using fd opened on /proc/self/fd.
+func procSelfFDFilters(fd int) seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_READLINKAT: []seccomp.Rule{
+			{
+				seccomp.EqualTo(fd),
+			},
+		},
+	}
+}
+
+// vsockFilters contains syscalls that are needed to carry AF_VSOCK connections
+// over host unix domain sockets. fd is the socket listening for connections
+// from the host.
+func vsockFilters(fd int) seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_ACCEPT4: []seccomp.Rule{
+			{
+				seccomp.EqualTo(fd),
+				seccomp.MatchAny{},
+				seccomp.MatchAny{},
+				seccomp.EqualTo(unix.SOCK_NONBLOCK | unix.SOCK_CLOEXEC),
+			},
+		},
+		unix.SYS_CONNECT: {},
+		unix.SYS_SOCKET: []seccomp.Rule{
+			{
+				seccomp.EqualTo(unix.AF_UNIX),
+				seccomp.EqualTo(unix.SOCK_STREAM | unix.SOCK_NONBLOCK | unix.SOCK_CLOEXEC),
+				seccomp.EqualTo(0),
+			},
+		},
+		unix.SYS_SOCKETPAIR: []seccomp.Rule{
+			{
+				seccomp.EqualTo(unix.AF_UNIX),
+				seccomp.EqualTo(unix.SOCK_STREAM | unix.SOCK_NONBLOCK | unix.SOCK_CLOEXEC),
+				seccomp.EqualTo(0),
+			},
+		},
+	}
+}
+
+// hostAbstractSocketFilters contains syscalls that are needed to connect to
+// host abstract Unix sockets.
+func hostAbstractSocketFilters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_CONNECT: {},
+		unix.SYS_SOCKET: []seccomp.Rule{
+			{
+				seccomp.EqualTo(unix.AF_UNIX),
+				seccomp.EqualTo(unix.SOCK_STREAM | unix.SOCK_CLOEXEC),
+				seccomp.EqualTo(0),
+			},
+			{
+				seccomp.EqualTo(unix.AF_UNIX),
+				seccomp.EqualTo(unix.SOCK_DGRAM | unix.SOCK_CLOEXEC),
+				seccomp.EqualTo(0),
+			},
+			{
+				seccomp.EqualTo(unix.AF_UNIX),
+				seccomp.EqualTo(unix.SOCK_SEQPACKET | unix.SOCK_CLOEXEC),
+				seccomp.EqualTo(0),
+			},
+		},
+	}
+}
+
+// numaFilters contains syscalls that are needed to bind the memory file to
+// host NUMA nodes.
+func numaFilters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_MBIND: []seccomp.Rule{
+			{
+				seccomp.MatchAny{},
+				seccomp.MatchAny{},
+				seccomp.EqualTo(linux.MPOL_BIND),
+				seccomp.MatchAny{},
+				seccomp.MatchAny{},
+				seccomp.EqualTo(0),
+			},
+		},
+	}
+}
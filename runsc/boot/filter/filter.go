@@ -25,16 +25,27 @@ import (
 
 // Options are seccomp filter related options.
 type Options struct {
-	Platform      platform.Platform
-	HostNetwork   bool
-	ProfileEnable bool
-	ControllerFD  int
+	Platform            platform.Platform
+	HostNetwork         bool
+	ProfileEnable       bool
+	DirectFS            bool
+	ControllerFD        int
+	MetricServerFD      int
+	HostAbstractSockets bool
+	NUMA                bool
+	ProcSelfFD          int
+	VsockListenFD       int
 }
 
 // Install installs seccomp filters for based on the given platform.
 func Install(opt Options) error {
 	s := allowedSyscalls
 	s.Merge(controlServerFilters(opt.ControllerFD))
+	if opt.MetricServerFD >= 0 {
+		// The metric server accepts connections in the same way as the
+		// control server.
+		s.Merge(controlServerFilters(opt.MetricServerFD))
+	}
 
 	// Set of additional filters used by -race and -msan. Returns empty
 	// when not enabled.
@@ -48,6 +59,24 @@ func Install(opt Options) error {
 		Report("profile enabled: syscall filters less restrictive!")
 		s.Merge(profileFilters())
 	}
+	if opt.DirectFS {
+		Report("directfs enabled: syscall filters less restrictive!")
+		s.Merge(directfsFilters())
+	}
+	if opt.HostAbstractSockets {
+		Report("host abstract sockets enabled: syscall filters less restrictive!")
+		s.Merge(hostAbstractSocketFilters())
+	}
+	if opt.NUMA {
+		Report("host NUMA binding enabled: syscall filters less restrictive!")
+		s.Merge(numaFilters())
+	}
+	if opt.ProcSelfFD >= 0 {
+		s.Merge(procSelfFDFilters(opt.ProcSelfFD))
+	}
+	if opt.VsockListenFD >= 0 {
+		s.Merge(vsockFilters(opt.VsockListenFD))
+	}
 
 	s.Merge(opt.Platform.SyscallFilters())
 
@@ -0,0 +1,108 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+)
+
+// ioLimitsAnnotation limits the file I/O of a container. Its value has the
+// format of cgroup v2 io.max without the device, e.g. "rbps=1048576
+// wiops=100"; see ParseIOLimits.
+const ioLimitsAnnotation = "dev.gvisor.spec.io.max"
+
+// ParseIOLimits parses file I/O limits in the format of cgroup v2 io.max
+// without the device: space-separated "key=value" pairs, where key is one of
+// rbps, wbps, riops and wiops, and value is a positive integer or "max" for
+// unlimited. Limits that are not given are unlimited.
+func ParseIOLimits(s string) (usage.IOLimits, error) {
+	var limits usage.IOLimits
+	for _, field := range strings.Fields(s) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return usage.IOLimits{}, fmt.Errorf("invalid I/O limit %q: want key=value", field)
+		}
+		key, val := kv[0], kv[1]
+		var limit uint64
+		if val != "max" {
+			var err error
+			limit, err = strconv.ParseUint(val, 10, 64)
+			if err != nil || limit == 0 {
+				return usage.IOLimits{}, fmt.Errorf("invalid I/O limit %q: value must be a positive integer or \"max\"", field)
+			}
+		}
+		switch key {
+		case "rbps":
+			limits.RBPS = limit
+		case "wbps":
+			limits.WBPS = limit
+		case "riops":
+			limits.RIOPS = limit
+		case "wiops":
+			limits.WIOPS = limit
+		default:
+			return usage.IOLimits{}, fmt.Errorf("invalid I/O limit %q: unknown key %q", field, key)
+		}
+	}
+	return limits, nil
+}
+
+// setIOLimits applies the file I/O limits requested by the spec's annotations
+// to container cid.
+func setIOLimits(spec *specs.Spec, cid string, k *kernel.Kernel) error {
+	val, ok := spec.Annotations[ioLimitsAnnotation]
+	if !ok {
+		return nil
+	}
+	limits, err := ParseIOLimits(val)
+	if err != nil {
+		return fmt.Errorf("invalid %s annotation: %w", ioLimitsAnnotation, err)
+	}
+	k.ContainerIO(cid).SetLimits(limits)
+	return nil
+}
+
+// ioStats returns the file I/O stats of container cid, or of all
+// containers if cid is nil.
+func ioStats(k *kernel.Kernel, cid *string) IO {
+	var cs []*usage.ContainerIO
+	for id, c := range k.ContainerIOs() {
+		if cid == nil || id == *cid {
+			cs = append(cs, c)
+		}
+	}
+	var out IO
+	for src := usage.IOSource(0); src < usage.NumIOSources; src++ {
+		entry := &IOEntry{Source: src.String()}
+		for _, c := range cs {
+			entry.Add(c.Stat(src))
+		}
+		out.Usage = append(out.Usage, entry)
+	}
+	for _, c := range cs {
+		out.ThrottledUsec += uint64(c.Throttled().Microseconds())
+	}
+	if cid != nil && len(cs) == 1 {
+		limits := cs[0].Limits()
+		out.Limits = &limits
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+)
+
+func TestParseIOLimits(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want usage.IOLimits
+	}{
+		{
+			in: "",
+		},
+		{
+			in:   "rbps=1048576",
+			want: usage.IOLimits{RBPS: 1048576},
+		},
+		{
+			in:   "rbps=1 wbps=2 riops=3 wiops=4",
+			want: usage.IOLimits{RBPS: 1, WBPS: 2, RIOPS: 3, WIOPS: 4},
+		},
+		{
+			in:   "wbps=100 wbps=max riops=10",
+			want: usage.IOLimits{RIOPS: 10},
+		},
+	} {
+		got, err := ParseIOLimits(tc.in)
+		if err != nil {
+			t.Errorf("ParseIOLimits(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseIOLimits(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseIOLimitsInvalid(t *testing.T) {
+	for _, in := range []string{
+		"rbps",
+		"rbps=",
+		"rbps=0",
+		"rbps=-1",
+		"rbps=1M",
+		"8:0 rbps=1",
+		"rbytes=1",
+	} {
+		if got, err := ParseIOLimits(in); err == nil {
+			t.Errorf("ParseIOLimits(%q) = %+v, want error", in, got)
+		}
+	}
+}
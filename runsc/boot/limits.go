@@ -54,7 +54,9 @@ func (d *defs) get() (*limits.LimitSet, error) {
 			return nil, err
 		}
 	}
-	return d.set, nil
+	// Callers apply the spec's overrides to the returned set, so hand out a
+	// copy to keep the defaults intact across containers.
+	return d.set.GetCopy(), nil
 }
 
 func (d *defs) initDefaults() error {
@@ -16,11 +16,15 @@
 package boot
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	mrand "math/rand"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	gtime "time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -32,24 +36,29 @@ import (
 	"gvisor.dev/gvisor/pkg/coverage"
 	"gvisor.dev/gvisor/pkg/cpuid"
 	"gvisor.dev/gvisor/pkg/fd"
+	"gvisor.dev/gvisor/pkg/lisafs"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/memutil"
+	"gvisor.dev/gvisor/pkg/metric"
 	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/refsvfs2"
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/fdimport"
 	"gvisor.dev/gvisor/pkg/sentry/fs/user"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/gofer"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/host"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/loader"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/seccheck"
 	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netfilter"
+	"gvisor.dev/gvisor/pkg/sentry/socket/vsock"
 	"gvisor.dev/gvisor/pkg/sentry/syscalls/linux/vfs2"
 	"gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
@@ -68,8 +77,10 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/raw"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/sctp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/runsc/boot/connectpolicy"
 	"gvisor.dev/gvisor/runsc/boot/filter"
 	_ "gvisor.dev/gvisor/runsc/boot/platforms" // register all platforms.
 	"gvisor.dev/gvisor/runsc/boot/pprof"
@@ -84,6 +95,7 @@ import (
 
 	// Include other supported socket providers.
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/netfilter"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/route"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/uevent"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/unix"
@@ -118,6 +130,15 @@ type Loader struct {
 
 	watchdog *watchdog.Watchdog
 
+	// watchdogBundle and watchdogLog are the watchdog diagnostic bundle file
+	// and the tail of the sentry log, kept to recreate the watchdog on
+	// restore. Both may be nil.
+	watchdogBundle *os.File
+	watchdogLog    *log.RingBuffer
+
+	// logRing retains recent sentry log statements, if not nil.
+	logRing *log.RingEmitter
+
 	// stopSignalForwarding disables forwarding of signals to the sandboxed
 	// container. It should be called when a sandbox is destroyed.
 	stopSignalForwarding func()
@@ -126,13 +147,39 @@ type Loader struct {
 	// should be called when a sandbox is destroyed.
 	stopProfiling func()
 
+	// metricExporter exports sandbox metrics in the Prometheus text
+	// exposition format.
+	metricExporter *metric.PrometheusExporter
+
+	// compat counts unimplemented syscalls and enforces the compat policy,
+	// if either is enabled. It may be nil.
+	compat *compatTracker
+
+	// metricServer serves metrics to scrapers, if enabled. It may be nil.
+	metricServer *metricServer
+
+	// procSelfFD is a host FD for /proc/self/fd, used to identify host
+	// eventfds passed into the sandbox. It is -1 if it couldn't be opened.
+	procSelfFD int
+
+	// vsockListenFD is the FD of the socket listening for vsock connections
+	// from the host, or -1.
+	vsockListenFD int
+
 	// restore is set to true if we are restoring a container.
 	restore bool
 
+	// totalMem is the total memory of the sandbox in bytes, or 0 if unknown.
+	totalMem uint64
+
+	// swapFile is the MemoryFile's swap file, or nil if swap is disabled. It is
+	// reused by the MemoryFile created on restore.
+	swapFile *os.File
+
 	// sandboxID is the ID for the whole sandbox.
 	sandboxID string
 
-	// mu guards processes.
+	// mu guards processes and exitWaiters.
 	mu sync.Mutex
 
 	// processes maps containers init process and invocation of exec. Root
@@ -142,6 +189,23 @@ type Loader struct {
 	// processes is guarded by mu.
 	processes map[execID]*execProcess
 
+	// exitWaiters maps thread groups that are being waited on to a channel
+	// that is closed once the thread group has exited. A single goroutine
+	// waits for each thread group, regardless of how many clients are waiting
+	// on it, and removes the entry once the thread group has exited. This
+	// ensures that waits that time out don't leave anything behind.
+	//
+	// exitWaiters is guarded by mu.
+	exitWaiters map[*kernel.ThreadGroup]chan struct{}
+
+	// reconnectInfo maps the IDs of containers whose gofers can be recovered
+	// to the information needed to reconnect their filesystems to the new
+	// gofer. It is only populated if config.Config.GoferReconnectTimeout is
+	// set.
+	//
+	// reconnectInfo is guarded by mu.
+	reconnectInfo map[string]*containerInfo
+
 	// mountHints provides extra information about mounts for containers that
 	// apply to the entire pod.
 	mountHints *podMountHints
@@ -149,6 +213,10 @@ type Loader struct {
 	// productName is the value to show in
 	// /sys/devices/virtual/dmi/id/product_name.
 	productName string
+
+	// dhcp records the network configuration leased with DHCP for the
+	// sandbox's interfaces.
+	dhcp dhcpLeases
 }
 
 // execID uniquely identifies a sentry process that is executed in a container.
@@ -172,6 +240,21 @@ type execProcess struct {
 	// TTY file is passed during container create and must be saved until
 	// container start.
 	hostTTY *fd.FD
+
+	// seccompFilter is the container's OCI seccomp filter, which is also
+	// installed on processes exec'd in the container. It is only set for the
+	// container init process, and is nil if the container has none.
+	seccompFilter *bpf.Program
+
+	// personality is the container's OCI personality, which is also applied
+	// to processes exec'd in the container. It is only set for the container
+	// init process.
+	personality uint32
+
+	// limits are the container's initial resource limits. Processes exec'd
+	// in the container get a copy of them. It is only set for the container
+	// init process.
+	limits *limits.LimitSet
 }
 
 func init() {
@@ -218,6 +301,36 @@ type Args struct {
 	// ProfileOpts contains the set of profiles to enable and the
 	// corresponding FDs where profile data will be written.
 	ProfileOpts profile.Opts
+	// MetricServerFD is the FD of a bound unix domain socket on which metrics
+	// are served, or -1 if the metric server is disabled. The Loader takes
+	// ownership of this FD and may close it at any time.
+	MetricServerFD int
+	// ConnectPolicyFD is the FD of a stream socket connected to the connect
+	// policy server, or -1 if outbound TCP connections aren't checked. The
+	// Loader takes ownership of this FD.
+	ConnectPolicyFD int
+	// VsockListenFD is the FD of the socket listening for vsock connections
+	// from the host, or -1. The Loader takes ownership of this FD.
+	VsockListenFD int
+	// VsockDirFD is the FD of the directory containing the vsock socket, or
+	// -1 if AF_VSOCK is disabled. The Loader takes ownership of this FD.
+	VsockDirFD int
+	// CompatPolicyFD is the FD of the file passed in the --compat-policy
+	// flag, or -1. The Loader takes ownership of this FD.
+	CompatPolicyFD int
+	// SwapFD is the FD of the swap file created in the --swap-dir directory,
+	// or -1 if swap is disabled. The Loader takes ownership of this FD.
+	SwapFD int
+	// WatchdogBundle is the file to write the watchdog diagnostic bundle to.
+	// It may be nil.
+	WatchdogBundle *os.File
+	// LogRing, if not nil, retains recent sentry log statements for the
+	// control server.
+	LogRing *log.RingEmitter
+
+	// WatchdogLog holds the tail of the sentry log included in the watchdog
+	// diagnostic bundle. It may be nil.
+	WatchdogLog *log.RingBuffer
 }
 
 // make sure stdioFDs are always the same on initial start and on restore
@@ -239,7 +352,10 @@ func New(args Args) (*Loader, error) {
 	}
 
 	kernel.FUSEEnabled = args.Conf.FUSE
+	kernel.MemfdSecretEnabled = args.Conf.MemfdSecret
+	kernel.RSeqEnabled = args.Conf.RSeq
 	kernel.LISAFSEnabled = args.Conf.Lisafs
+	lisafs.SetSlowRPCThreshold(args.Conf.FSGoferSlowOpThreshold)
 	bufferv2.PoolingEnabled = args.Conf.BufferPooling
 	vfs2.Override()
 
@@ -270,6 +386,14 @@ func New(args Args) (*Loader, error) {
 		info.goferFDs = append(info.goferFDs, fd.New(goferFD))
 	}
 
+	if args.Conf.DirectFS {
+		// Files accessed with directfs are reopened through /proc/self/fd,
+		// which must be opened before seccomp filters are installed.
+		if err := gofer.OpenProcSelfFD(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create kernel and platform.
 	p, err := createPlatform(args.Conf, args.Device)
 	if err != nil {
@@ -280,7 +404,11 @@ func New(args Args) (*Loader, error) {
 	}
 
 	// Create memory file.
-	mf, err := createMemoryFile()
+	var swapFile *os.File
+	if args.SwapFD >= 0 {
+		swapFile = os.NewFile(uintptr(args.SwapFD), "swap file")
+	}
+	mf, err := createMemoryFile(args.Conf, swapFile)
 	if err != nil {
 		return nil, fmt.Errorf("creating memory file: %w", err)
 	}
@@ -296,11 +424,22 @@ func New(args Args) (*Loader, error) {
 
 	// Create timekeeper.
 	tk := kernel.NewTimekeeper(k, vdso.ParamPage.FileRange())
-	tk.SetClocks(time.NewCalibratedClocks())
+	tk.SetClocks(createClocks(args.Conf))
+	tk.SetVirtualTimeQuantum(args.Conf.VirtualTimeQuantum)
 
 	if err := enableStrace(args.Conf); err != nil {
 		return nil, fmt.Errorf("enabling strace: %w", err)
 	}
+	if args.Conf.SyscallLatencyMetric {
+		if err := kernel.EnableSyscallLatencyMetric(); err != nil {
+			return nil, fmt.Errorf("enabling syscall latency metric: %w", err)
+		}
+	}
+
+	if args.ConnectPolicyFD >= 0 {
+		policy := connectpolicy.New(os.NewFile(uintptr(args.ConnectPolicyFD), "connect policy socket"), connectpolicy.DefaultTimeout)
+		tcpConnectHook = policy.Hook
+	}
 
 	// Create root network namespace/stack.
 	netns, err := newRootNetworkNamespace(args.Conf, tk, k)
@@ -328,6 +467,13 @@ func New(args Args) (*Loader, error) {
 		caps,
 		auth.NewRootUserNamespace())
 
+	var hostCPUs []uint
+	if args.Conf.HostCPUAffinity {
+		if hostCPUs, err = sandboxHostCPUs(args.Conf); err != nil {
+			return nil, err
+		}
+		args.NumCPU = len(hostCPUs)
+	}
 	if args.NumCPU == 0 {
 		args.NumCPU = runtime.NumCPU()
 	}
@@ -337,27 +483,34 @@ func New(args Args) (*Loader, error) {
 	if args.TotalMem > 0 {
 		// Adjust the total memory returned by the Sentry so that applications that
 		// use /proc/meminfo can make allocations based on this limit.
-		usage.MinimumTotalMemoryBytes = args.TotalMem
-		usage.MaximumTotalMemoryBytes = args.TotalMem
+		usage.SetTotalMemory(args.TotalMem)
 		log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(1<<30))
 	}
 
 	// Initiate the Kernel object, which is required by the Context passed
 	// to createVFS in order to mount (among other things) procfs.
 	if err = k.Init(kernel.InitKernelArgs{
-		FeatureSet:                  cpuid.HostFeatureSet().Fixed(),
-		Timekeeper:                  tk,
-		RootUserNamespace:           creds.UserNamespace,
-		RootNetworkNamespace:        netns,
-		ApplicationCores:            uint(args.NumCPU),
-		Vdso:                        vdso,
-		RootUTSNamespace:            kernel.NewUTSNamespace(args.Spec.Hostname, args.Spec.Hostname, creds.UserNamespace),
-		RootIPCNamespace:            kernel.NewIPCNamespace(creds.UserNamespace),
-		RootAbstractSocketNamespace: kernel.NewAbstractSocketNamespace(),
-		PIDNamespace:                kernel.NewRootPIDNamespace(creds.UserNamespace),
+		FeatureSet:           cpuid.HostFeatureSet().Fixed(),
+		Timekeeper:           tk,
+		RootUserNamespace:    creds.UserNamespace,
+		RootNetworkNamespace: netns,
+		ApplicationCores:     uint(args.NumCPU),
+		HostCPUs:             hostCPUs,
+		Vdso:                 vdso,
+		RootUTSNamespace:     kernel.NewUTSNamespace(args.Spec.Hostname, args.Spec.Hostname, creds.UserNamespace),
+		RootIPCNamespace:     kernel.NewIPCNamespace(creds.UserNamespace),
+		PIDNamespace:         kernel.NewRootPIDNamespace(creds.UserNamespace),
 	}); err != nil {
 		return nil, fmt.Errorf("initializing kernel: %w", err)
 	}
+	if args.Conf.CoreDumpDir != "" {
+		k.SetCorePattern(CoreDumpPattern)
+	}
+	if args.Conf.HostAbstractSockets != "" {
+		names := strings.Split(args.Conf.HostAbstractSockets, ",")
+		log.Infof("Forwarding abstract socket names to the host: %q", names)
+		k.RootNetworkNamespace().AbstractSockets().SetHostNames(names)
+	}
 
 	if err := registerFilesystems(k); err != nil {
 		return nil, fmt.Errorf("registering filesystems: %w", err)
@@ -373,19 +526,27 @@ func New(args Args) (*Loader, error) {
 	}
 
 	// Create a watchdog.
-	dogOpts := watchdog.DefaultOpts
-	dogOpts.TaskTimeoutAction = args.Conf.WatchdogAction
-	dog := watchdog.New(k, dogOpts)
+	dog := watchdog.New(k, watchdogOpts(args.Conf, k, args.WatchdogBundle, args.WatchdogLog))
 
 	procArgs, err := createProcessArgs(args.ID, args.Spec, creds, k, k.RootPIDNamespace())
 	if err != nil {
 		return nil, fmt.Errorf("creating init process for root container: %w", err)
 	}
 	info.procArgs = procArgs
+	if err := setIOLimits(args.Spec, args.ID, k); err != nil {
+		return nil, err
+	}
 
 	if err := initCompatLogs(args.UserLogFD); err != nil {
 		return nil, fmt.Errorf("initializing compat logs: %w", err)
 	}
+	compat, err := newCompatTracker(args.Conf.CompatTracking, args.CompatPolicyFD)
+	if err != nil {
+		return nil, fmt.Errorf("initializing compat tracking: %w", err)
+	}
+	if compat != nil {
+		k.SetUnimplementedSyscallObserver(compat)
+	}
 
 	mountHints, err := newPodMountHints(args.Spec)
 	if err != nil {
@@ -403,6 +564,25 @@ func New(args Args) (*Loader, error) {
 	defer hostFilesystem.DecRef(k.SupervisorContext())
 	k.SetHostMount(k.VFS().NewDisconnectedMount(hostFilesystem, nil, &vfs.MountOptions{}))
 
+	// Identifying host eventfds passed into the sandbox requires
+	// /proc/self/fd, which must be opened before seccomp filters are
+	// installed.
+	procSelfFD, err := host.OpenProcSelfFD()
+	if err != nil {
+		log.Warningf("Failed to open /proc/self/fd, host eventfds can't be imported: %v", err)
+		procSelfFD = -1
+	}
+
+	vsockListenFD := -1
+	if args.Conf.VsockCID != 0 {
+		transport, err := vsock.NewUDSTransport(args.VsockListenFD, args.VsockDirFD, filepath.Base(args.Conf.VsockUDS))
+		if err != nil {
+			return nil, fmt.Errorf("creating vsock transport: %w", err)
+		}
+		vsock.Register(vsock.NewStack(uint32(args.Conf.VsockCID), transport))
+		vsockListenFD = args.VsockListenFD
+	}
+
 	if args.PodInitConfigFD >= 0 {
 		if err := setupSeccheck(args.PodInitConfigFD, args.SinkFDs); err != nil {
 			log.Warningf("unable to configure event session: %v", err)
@@ -411,15 +591,26 @@ func New(args Args) (*Loader, error) {
 
 	eid := execID{cid: args.ID}
 	l := &Loader{
-		k:             k,
-		watchdog:      dog,
-		sandboxID:     args.ID,
-		processes:     map[execID]*execProcess{eid: {}},
-		mountHints:    mountHints,
-		root:          info,
-		stopProfiling: stopProfiling,
-		productName:   args.ProductName,
-	}
+		k:              k,
+		watchdog:       dog,
+		watchdogBundle: args.WatchdogBundle,
+		watchdogLog:    args.WatchdogLog,
+		logRing:        args.LogRing,
+		sandboxID:      args.ID,
+		processes:      map[execID]*execProcess{eid: {}},
+		mountHints:     mountHints,
+		root:           info,
+		stopProfiling:  stopProfiling,
+		productName:    args.ProductName,
+		metricExporter: newMetricExporter(args.ID),
+		compat:         compat,
+		totalMem:       args.TotalMem,
+		swapFile:       swapFile,
+		procSelfFD:     procSelfFD,
+		vsockListenFD:  vsockListenFD,
+	}
+	l.enableOOMKiller()
+	l.k.EnableCacheShrinker(l.totalMem)
 
 	// We don't care about child signals; some platforms can generate a
 	// tremendous number of useless ones (I'm looking at you, ptrace).
@@ -443,6 +634,14 @@ func New(args Args) (*Loader, error) {
 		return nil, fmt.Errorf("starting control server: %w", err)
 	}
 
+	if args.MetricServerFD >= 0 {
+		ms, err := startMetricServer(args.MetricServerFD, l.metricExporter)
+		if err != nil {
+			return nil, fmt.Errorf("starting metric server: %w", err)
+		}
+		l.metricServer = ms
+	}
+
 	return l, nil
 }
 
@@ -463,25 +662,73 @@ func createProcessArgs(id string, spec *specs.Spec, creds *auth.Credentials, k *
 		wd = "/"
 	}
 
+	timens, err := createTimeNamespace(spec, creds, k)
+	if err != nil {
+		return kernel.CreateProcessArgs{}, fmt.Errorf("creating time namespace: %w", err)
+	}
+	personality, err := specutils.Personality(spec)
+	if err != nil {
+		return kernel.CreateProcessArgs{}, err
+	}
+
 	// Create the process arguments.
 	procArgs := kernel.CreateProcessArgs{
-		Argv:                    spec.Process.Args,
-		Envv:                    env,
-		WorkingDirectory:        wd,
-		Credentials:             creds,
-		Umask:                   0022,
-		Limits:                  ls,
-		MaxSymlinkTraversals:    linux.MaxSymlinkTraversals,
-		UTSNamespace:            k.RootUTSNamespace(),
-		IPCNamespace:            k.RootIPCNamespace(),
-		AbstractSocketNamespace: k.RootAbstractSocketNamespace(),
-		ContainerID:             id,
-		PIDNamespace:            pidns,
+		Argv:                 spec.Process.Args,
+		Envv:                 env,
+		WorkingDirectory:     wd,
+		Credentials:          creds,
+		Umask:                0022,
+		Limits:               ls,
+		MaxSymlinkTraversals: linux.MaxSymlinkTraversals,
+		UTSNamespace:         k.RootUTSNamespace(),
+		IPCNamespace:         k.RootIPCNamespace(),
+		TimeNamespace:        timens,
+		ContainerID:          id,
+		PIDNamespace:         pidns,
+		Personality:          personality,
 	}
 
 	return procArgs, nil
 }
 
+const (
+	// timensMonotonicOffsetAnnotation and timensBoottimeOffsetAnnotation
+	// are OCI annotations that put the container's processes in a time
+	// namespace with the given CLOCK_MONOTONIC and CLOCK_BOOTTIME offsets,
+	// formatted as Go durations (e.g. "8760h").
+	timensMonotonicOffsetAnnotation = "dev.gvisor.spec.timens.monotonic-offset"
+	timensBoottimeOffsetAnnotation  = "dev.gvisor.spec.timens.boottime-offset"
+)
+
+// createTimeNamespace returns the time namespace requested by the spec's
+// annotations, or nil if the root time namespace should be used.
+func createTimeNamespace(spec *specs.Spec, creds *auth.Credentials, k *kernel.Kernel) (*kernel.TimeNamespace, error) {
+	var offsets [2]gtime.Duration
+	found := false
+	for i, name := range []string{timensMonotonicOffsetAnnotation, timensBoottimeOffsetAnnotation} {
+		val, ok := spec.Annotations[name]
+		if !ok {
+			continue
+		}
+		d, err := gtime.ParseDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation %q: %w", name, val, err)
+		}
+		offsets[i] = d
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	timens := k.RootTimeNamespace().NewChild(creds.UserNamespace)
+	// The offsets are set by the runtime rather than by the container, so
+	// they don't require CAP_SYS_TIME.
+	if err := timens.SetOffsets(auth.NewRootCredentials(creds.UserNamespace), offsets[0], offsets[1]); err != nil {
+		return nil, fmt.Errorf("setting time namespace offsets %v: %w", offsets, err)
+	}
+	return timens, nil
+}
+
 // Destroy cleans up all resources used by the loader.
 //
 // Note that this will block until all open control server connections have
@@ -498,6 +745,10 @@ func (l *Loader) Destroy() {
 	// profiling operations.
 	l.ctrl.stop()
 
+	if l.metricServer != nil {
+		l.metricServer.stop()
+	}
+
 	// Release all kernel resources. This is only safe after we can no longer
 	// save/restore.
 	l.k.Release()
@@ -518,16 +769,91 @@ func (l *Loader) Destroy() {
 	l.stopProfiling()
 }
 
+// watchdogOpts returns the watchdog options for conf. bundleFile and logRing
+// may be nil.
+func watchdogOpts(conf *config.Config, k *kernel.Kernel, bundleFile *os.File, logRing *log.RingBuffer) watchdog.Opts {
+	opts := watchdog.DefaultOpts
+	opts.TaskTimeoutAction = conf.WatchdogAction
+	if conf.WatchdogAction&watchdog.Bundle == 0 {
+		return opts
+	}
+	if bundleFile != nil {
+		opts.BundleFile = bundleFile
+	}
+	if logRing != nil {
+		opts.BundleSections = append(opts.BundleSections, watchdog.BundleSection{
+			Name: "sentry.log",
+			Write: func(w io.Writer) error {
+				_, err := logRing.WriteTo(w)
+				return err
+			},
+		})
+	}
+	opts.BundleSections = append(opts.BundleSections, watchdog.BundleSection{
+		Name: "netstack.json",
+		Write: func(w io.Writer) error {
+			eps, ok := k.RootNetworkNamespace().Stack().(*netstack.Stack)
+			if !ok {
+				_, err := io.WriteString(w, "{}\n")
+				return err
+			}
+			var out NetworkStatsOut
+			n := Network{Stack: eps.Stack}
+			if err := n.Stats(nil, &out); err != nil {
+				return err
+			}
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(&out)
+		},
+	})
+	return opts
+}
+
+// sandboxHostCPUs returns the host CPUs that back application CPUs when host
+// CPU affinity passthrough is enabled: the CPUs that the sandbox process is
+// allowed to run on, which are those of its cgroup cpuset.
+func sandboxHostCPUs(conf *config.Config) ([]uint, error) {
+	if conf.Platform != "kvm" {
+		return nil, fmt.Errorf("--host-cpu-affinity is not supported by platform %q", conf.Platform)
+	}
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, fmt.Errorf("getting host CPU affinity: %w", err)
+	}
+	var cpus []uint
+	for cpu := 0; cpu < len(set)*64; cpu++ {
+		if set.IsSet(cpu) {
+			cpus = append(cpus, uint(cpu))
+		}
+	}
+	log.Infof("Host CPUs backing application CPUs: %v", cpus)
+	return cpus, nil
+}
+
 func createPlatform(conf *config.Config, deviceFile *os.File) (platform.Platform, error) {
 	p, err := platform.Lookup(conf.Platform)
 	if err != nil {
 		panic(fmt.Sprintf("invalid platform %s: %s", conf.Platform, err))
 	}
 	log.Infof("Platform: %s", conf.Platform)
+	if conf.VirtualTime {
+		// Make TSC reads return virtual time too.
+		platform.EnableTSCTrapping()
+	}
 	return p.New(deviceFile)
 }
 
-func createMemoryFile() (*pgalloc.MemoryFile, error) {
+// createClocks returns the clocks from which the sandbox's time is read.
+func createClocks(conf *config.Config) time.Clocks {
+	if conf.VirtualTime {
+		log.Infof("Using virtual time")
+		return time.NewVirtualClocks(gtime.Now().UnixNano())
+	}
+	return time.NewCalibratedClocks()
+}
+
+func createMemoryFile(conf *config.Config, swapFile *os.File) (*pgalloc.MemoryFile, error) {
 	const memfileName = "runsc-memory"
 	memfd, err := memutil.CreateMemFD(memfileName, 0)
 	if err != nil {
@@ -537,7 +863,16 @@ func createMemoryFile() (*pgalloc.MemoryFile, error) {
 	// We can't enable pgalloc.MemoryFileOpts.UseHostMemcgPressure even if
 	// there are memory cgroups specified, because at this point we're already
 	// in a mount namespace in which the relevant cgroupfs is not visible.
-	mf, err := pgalloc.NewMemoryFile(memfile, pgalloc.MemoryFileOpts{})
+	nodes, err := conf.HostNUMANodes()
+	if err != nil {
+		_ = memfile.Close()
+		return nil, err
+	}
+	mf, err := pgalloc.NewMemoryFile(memfile, pgalloc.MemoryFileOpts{
+		HostNUMANodes: nodes,
+		NUMATopology:  conf.NUMATopology,
+		SwapFile:      swapFile,
+	})
 	if err != nil {
 		_ = memfile.Close()
 		return nil, fmt.Errorf("error creating pgalloc.MemoryFile: %w", err)
@@ -551,10 +886,19 @@ func (l *Loader) installSeccompFilters() error {
 		filter.Report("syscall filter is DISABLED. Running in less secure mode.")
 	} else {
 		opts := filter.Options{
-			Platform:      l.k.Platform,
-			HostNetwork:   l.root.conf.Network == config.NetworkHost,
-			ProfileEnable: l.root.conf.ProfileEnable,
-			ControllerFD:  l.ctrl.srv.FD(),
+			Platform:            l.k.Platform,
+			HostNetwork:         l.root.conf.Network == config.NetworkHost,
+			ProfileEnable:       l.root.conf.ProfileEnable,
+			DirectFS:            l.root.conf.DirectFS,
+			ControllerFD:        l.ctrl.srv.FD(),
+			MetricServerFD:      -1,
+			HostAbstractSockets: l.root.conf.HostAbstractSockets != "",
+			NUMA:                l.root.conf.NUMANodes != "",
+			ProcSelfFD:          l.procSelfFD,
+			VsockListenFD:       l.vsockListenFD,
+		}
+		if l.metricServer != nil {
+			opts.MetricServerFD = l.metricServer.FD()
 		}
 		if err := filter.Install(opts); err != nil {
 			return fmt.Errorf("installing seccomp filters: %w", err)
@@ -617,10 +961,16 @@ func (l *Loader) run() error {
 			tg  *kernel.ThreadGroup
 			err error
 		)
-		tg, ep.tty, err = l.createContainerProcess(true, l.sandboxID, &l.root)
+		ep.seccompFilter, err = buildOCISeccompFilter(&l.root)
+		if err != nil {
+			return err
+		}
+		tg, ep.tty, err = l.createContainerProcess(true, l.sandboxID, &l.root, ep.seccompFilter)
 		if err != nil {
 			return err
 		}
+		ep.personality = l.root.procArgs.Personality
+		ep.limits = l.root.procArgs.Limits.GetCopy()
 
 		if seccheck.Global.Enabled(seccheck.PointContainerStart) {
 			evt := pb.Start{
@@ -728,12 +1078,16 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 		if ns.Path != "" {
 			for _, p := range l.processes {
 				if ns.Path == p.pidnsPath {
+					log.Debugf("Joining PID namespace named %q", ns.Path)
 					pidns = p.tg.PIDNamespace()
 					break
 				}
 			}
 		}
 		if pidns == nil {
+			if ns.Path != "" {
+				log.Warningf("PID namespace %q not found, running in new PID namespace", ns.Path)
+			}
 			pidns = l.k.RootPIDNamespace().NewChild(l.k.RootUserNamespace())
 		}
 		ep.pidnsPath = ns.Path
@@ -750,6 +1104,9 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 	if err != nil {
 		return fmt.Errorf("creating new process: %w", err)
 	}
+	if err := setIOLimits(spec, cid, l.k); err != nil {
+		return err
+	}
 
 	// Use stdios or TTY depending on the spec configuration.
 	if spec.Process.Terminal {
@@ -765,10 +1122,16 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 		info.stdioFDs = stdioFDs
 	}
 
-	ep.tg, ep.tty, err = l.createContainerProcess(false, cid, info)
+	ep.seccompFilter, err = buildOCISeccompFilter(info)
+	if err != nil {
+		return err
+	}
+	ep.tg, ep.tty, err = l.createContainerProcess(false, cid, info, ep.seccompFilter)
 	if err != nil {
 		return err
 	}
+	ep.personality = info.procArgs.Personality
+	ep.limits = info.procArgs.Limits.GetCopy()
 
 	if seccheck.Global.Enabled(seccheck.PointContainerStart) {
 		evt := pb.Start{
@@ -794,7 +1157,7 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 	return nil
 }
 
-func (l *Loader) createContainerProcess(root bool, cid string, info *containerInfo) (*kernel.ThreadGroup, *host.TTYFileDescription, error) {
+func (l *Loader) createContainerProcess(root bool, cid string, info *containerInfo, seccompFilter *bpf.Program) (*kernel.ThreadGroup, *host.TTYFileDescription, error) {
 	// Create the FD map, which will set stdin, stdout, and stderr.
 	ctx := info.procArgs.NewContext(l.k)
 	fdTable, ttyFile, err := createFDTable(ctx, info.spec.Process.Terminal, info.stdioFDs, info.spec.Process.User)
@@ -809,9 +1172,22 @@ func (l *Loader) createContainerProcess(root bool, cid string, info *containerIn
 	if len(info.goferFDs) < 1 {
 		return nil, nil, fmt.Errorf("rootfs gofer FD not found")
 	}
-	l.startGoferMonitor(cid, int32(info.goferFDs[0].FD()))
+	if info.conf.GoferReconnectTimeout > 0 {
+		// The container survives the death of its gofer, which can be
+		// recovered with reconnectGofer.
+		if l.reconnectInfo == nil {
+			l.reconnectInfo = make(map[string]*containerInfo)
+		}
+		l.reconnectInfo[cid] = info
+	} else {
+		l.startGoferMonitor(cid, int32(info.goferFDs[0].FD()))
+	}
 
 	mntr := newContainerMounter(info, l.k, l.mountHints, l.productName)
+	mntr.cid = cid
+	if info.conf.DHCPResolvConf {
+		mntr.resolvConf = l.dhcp.resolvConf()
+	}
 	if root {
 		if err := mntr.processHints(info.conf, info.procArgs.Credentials); err != nil {
 			return nil, nil, err
@@ -843,33 +1219,38 @@ func (l *Loader) createContainerProcess(root bool, cid string, info *containerIn
 	}
 
 	// Install seccomp filters with the new task if there are any.
-	if info.conf.OCISeccomp {
-		if info.spec.Linux != nil && info.spec.Linux.Seccomp != nil {
-			program, err := seccomp.BuildProgram(info.spec.Linux.Seccomp)
-			if err != nil {
-				return nil, nil, fmt.Errorf("building seccomp program: %w", err)
-			}
-
-			if log.IsLogging(log.Debug) {
-				out, _ := bpf.DecodeProgram(program)
-				log.Debugf("Installing OCI seccomp filters\nProgram:\n%s", out)
-			}
-
-			task := tg.Leader()
-			// NOTE: It seems Flags are ignored by runc so we ignore them too.
-			if err := task.AppendSyscallFilter(program, true); err != nil {
-				return nil, nil, fmt.Errorf("appending seccomp filters: %w", err)
-			}
-		}
-	} else {
-		if info.spec.Linux != nil && info.spec.Linux.Seccomp != nil {
-			log.Warningf("Seccomp spec is being ignored")
+	if seccompFilter != nil {
+		// NOTE: It seems Flags are ignored by runc so we ignore them too.
+		if err := tg.Leader().AppendSyscallFilter(*seccompFilter, true, nil); err != nil {
+			return nil, nil, fmt.Errorf("appending seccomp filters: %w", err)
 		}
 	}
 
 	return tg, ttyFile, nil
 }
 
+// buildOCISeccompFilter builds the OCI seccomp filter of the container
+// described by info. It returns nil if the container has no seccomp
+// configuration, or if OCI seccomp is disabled.
+func buildOCISeccompFilter(info *containerInfo) (*bpf.Program, error) {
+	if info.spec.Linux == nil || info.spec.Linux.Seccomp == nil {
+		return nil, nil
+	}
+	if !info.conf.OCISeccomp {
+		log.Warningf("Seccomp spec is being ignored")
+		return nil, nil
+	}
+	program, err := seccomp.BuildProgram(info.spec.Linux.Seccomp)
+	if err != nil {
+		return nil, fmt.Errorf("building seccomp program: %w", err)
+	}
+	if log.IsLogging(log.Debug) {
+		out, _ := bpf.DecodeProgram(program)
+		log.Debugf("Installing OCI seccomp filters\nProgram:\n%s", out)
+	}
+	return &program, nil
+}
+
 // startGoferMonitor runs a goroutine to monitor gofer's health. It polls on
 // the gofer FD looking for disconnects, and kills the container processes if
 // the rootfs FD disconnects.
@@ -910,6 +1291,43 @@ func (l *Loader) startGoferMonitor(cid string, rootfsGoferFD int32) {
 	}()
 }
 
+// reconnectGofer reconnects the filesystems of container cid to a new gofer
+// after its previous gofer died. goferFDs must be ordered like the FDs that
+// the container was started with.
+func (l *Loader) reconnectGofer(cid string, goferFDs []*fd.FD) error {
+	defer func() {
+		// Close the FDs that weren't used.
+		for _, f := range goferFDs {
+			_ = f.Close()
+		}
+	}()
+
+	l.mu.Lock()
+	info, ok := l.reconnectInfo[cid]
+	l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("gofer recovery is not enabled for container %q", cid)
+	}
+
+	newInfo := *info
+	newInfo.goferFDs = goferFDs
+	mntr := newContainerMounter(&newInfo, l.k, l.mountHints, l.productName)
+	fdmap, extFDMap, err := mntr.serverFDMaps(info.conf)
+	if err != nil {
+		return err
+	}
+	// Ext images remain open in the sandbox.
+	for _, fd := range extFDMap {
+		_ = unix.Close(fd)
+	}
+	log.Infof("Reconnecting %d filesystems of container %q to the new gofer", len(fdmap), cid)
+	err = gofer.Reconnect(l.k.SupervisorContext(), cid, fdmap)
+	for _, fd := range fdmap {
+		_ = unix.Close(fd)
+	}
+	return err
+}
+
 // destroySubcontainer stops a container if it is still running and cleans up
 // its filesystem.
 func (l *Loader) destroySubcontainer(cid string) error {
@@ -943,6 +1361,7 @@ func (l *Loader) destroySubcontainer(cid string) error {
 			delete(l.processes, key)
 		}
 	}
+	delete(l.reconnectInfo, cid)
 
 	log.Debugf("Container destroyed, cid: %s", cid)
 	return nil
@@ -983,11 +1402,30 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 		return 0, err
 	}
 	args.PIDNamespace = tg.PIDNamespace()
-
-	args.Limits, err = createLimitSet(l.root.spec)
-	if err != nil {
-		return 0, fmt.Errorf("creating limits: %w", err)
+	// Exec'd processes see the same clocks as the container's init.
+	args.TimeNamespace = tg.Leader().TimeNamespace()
+
+	// As with runc, exec'd processes are subject to the container's seccomp
+	// filter, but not to filters installed by the container's processes.
+	if ep := l.processes[execID{cid: args.ContainerID}]; ep != nil && ep.seccompFilter != nil {
+		args.SyscallFilters = []bpf.Program{*ep.seccompFilter}
+	}
+	// Like runc, exec'd processes get the container's personality and the
+	// limits from its spec, not those of the sandbox's root container.
+	var ls *limits.LimitSet
+	if ep := l.processes[execID{cid: args.ContainerID}]; ep != nil {
+		args.Personality = ep.personality
+		if ep.limits != nil {
+			ls = ep.limits.GetCopy()
+		}
+	}
+	if ls == nil {
+		ls, err = createLimitSet(l.root.spec)
+		if err != nil {
+			return 0, fmt.Errorf("creating limits: %w", err)
+		}
 	}
+	args.Limits = ls
 
 	// Start the process.
 	proc := control.Proc{Kernel: l.k}
@@ -1006,8 +1444,10 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 	return tgid, nil
 }
 
-// waitContainer waits for the init process of a container to exit.
-func (l *Loader) waitContainer(cid string, waitStatus *uint32) error {
+// waitContainer waits for the init process of a container to exit. If timeout
+// is positive and the process hasn't exited within timeout, ErrWaitTimeout is
+// returned.
+func (l *Loader) waitContainer(cid string, timeout gtime.Duration, waitStatus *uint32) error {
 	// Don't defer unlock, as doing so would make it impossible for
 	// multiple clients to wait on the same container.
 	tg, err := l.threadGroupFromID(execID{cid: cid})
@@ -1017,7 +1457,10 @@ func (l *Loader) waitContainer(cid string, waitStatus *uint32) error {
 
 	// If the thread either has already exited or exits during waiting,
 	// consider the container exited.
-	ws := l.wait(tg)
+	ws, err := l.wait(tg, timeout)
+	if err != nil {
+		return err
+	}
 	*waitStatus = ws
 
 	// Check for leaks and write coverage report after the root container has
@@ -1031,7 +1474,7 @@ func (l *Loader) waitContainer(cid string, waitStatus *uint32) error {
 	return nil
 }
 
-func (l *Loader) waitPID(tgid kernel.ThreadID, cid string, waitStatus *uint32) error {
+func (l *Loader) waitPID(tgid kernel.ThreadID, cid string, timeout gtime.Duration, waitStatus *uint32) error {
 	if tgid <= 0 {
 		return fmt.Errorf("PID (%d) must be positive", tgid)
 	}
@@ -1040,7 +1483,11 @@ func (l *Loader) waitPID(tgid kernel.ThreadID, cid string, waitStatus *uint32) e
 	eid := execID{cid: cid, pid: tgid}
 	execTG, err := l.threadGroupFromID(eid)
 	if err == nil {
-		ws := l.wait(execTG)
+		ws, err := l.wait(execTG, timeout)
+		if err != nil {
+			// Keep the process around so that it can be waited on again.
+			return err
+		}
 		*waitStatus = ws
 
 		l.mu.Lock()
@@ -1063,16 +1510,62 @@ func (l *Loader) waitPID(tgid kernel.ThreadID, cid string, waitStatus *uint32) e
 	if tg.Leader().ContainerID() != cid {
 		return fmt.Errorf("process %d is part of a different container: %q", tgid, tg.Leader().ContainerID())
 	}
-	ws := l.wait(tg)
+	ws, err := l.wait(tg, timeout)
+	if err != nil {
+		return err
+	}
 	*waitStatus = ws
 	return nil
 }
 
 // wait waits for the process with TGID 'tgid' in a container's PID namespace
-// to exit.
-func (l *Loader) wait(tg *kernel.ThreadGroup) uint32 {
-	tg.WaitExited()
-	return uint32(tg.ExitStatus())
+// to exit. If timeout is positive and the process hasn't exited within
+// timeout, ErrWaitTimeout is returned.
+func (l *Loader) wait(tg *kernel.ThreadGroup, timeout gtime.Duration) (uint32, error) {
+	exited := l.exitedChan(tg)
+	if timeout <= 0 {
+		<-exited
+		return uint32(tg.ExitStatus()), nil
+	}
+
+	t := gtime.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-exited:
+	case <-t.C:
+		// select picks randomly among ready cases, so check again in case
+		// the process exited at the same time.
+		select {
+		case <-exited:
+		default:
+			return 0, ErrWaitTimeout
+		}
+	}
+	return uint32(tg.ExitStatus()), nil
+}
+
+// exitedChan returns a channel that is closed once tg has exited.
+func (l *Loader) exitedChan(tg *kernel.ThreadGroup) <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if exited, ok := l.exitWaiters[tg]; ok {
+		return exited
+	}
+	if l.exitWaiters == nil {
+		l.exitWaiters = make(map[*kernel.ThreadGroup]chan struct{})
+	}
+	exited := make(chan struct{})
+	l.exitWaiters[tg] = exited
+	go func() {
+		tg.WaitExited()
+
+		l.mu.Lock()
+		delete(l.exitWaiters, tg)
+		l.mu.Unlock()
+		close(exited)
+	}()
+	return exited
 }
 
 // WaitForStartSignal waits for a start signal from the control server.
@@ -1101,7 +1594,7 @@ func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, uniqueID st
 		// No network namespacing support for hostinet yet, hence creator is nil.
 		return inet.NewRootNamespace(hostinet.NewStack(), nil), nil
 
-	case config.NetworkNone, config.NetworkSandbox:
+	case config.NetworkNone, config.NetworkSandbox, config.NetworkDHCP:
 		s, err := newEmptySandboxNetworkStack(clock, uniqueID, conf.AllowPacketEndpointWrite)
 		if err != nil {
 			return nil, err
@@ -1119,6 +1612,10 @@ func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, uniqueID st
 
 }
 
+// tcpConnectHook, if not nil, is installed in all sandbox network stacks. It's
+// set from Args.ConnectPolicyFD before the first stack is created.
+var tcpConnectHook stack.TCPConnectHook
+
 func newEmptySandboxNetworkStack(clock tcpip.Clock, uniqueID stack.UniqueID, allowPacketEndpointWrite bool) (inet.Stack, error) {
 	netProtos := []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol, arp.NewProtocol}
 	transProtos := []stack.TransportProtocolFactory{
@@ -1126,6 +1623,7 @@ func newEmptySandboxNetworkStack(clock tcpip.Clock, uniqueID stack.UniqueID, all
 		udp.NewProtocol,
 		icmp.NewProtocol4,
 		icmp.NewProtocol6,
+		sctp.NewProtocol,
 	}
 	s := netstack.Stack{Stack: stack.New(stack.Options{
 		NetworkProtocols:   netProtos,
@@ -1140,6 +1638,9 @@ func newEmptySandboxNetworkStack(clock tcpip.Clock, uniqueID stack.UniqueID, all
 		UniqueID:                 uniqueID,
 		DefaultIPTables:          netfilter.DefaultLinuxTables,
 	})}
+	if tcpConnectHook != nil {
+		s.Stack.SetTCPConnectHook(tcpConnectHook)
+	}
 
 	// Enable SACK Recovery.
 	{
@@ -1306,6 +1807,65 @@ func (l *Loader) signalForegrondProcessGroup(cid string, tgid kernel.ThreadID, s
 	return lastErr
 }
 
+// resize changes the number of CPUs and the total memory of the sandbox. A
+// value of 0 leaves the corresponding resource unchanged. If the new total
+// memory is below current usage, evictable memory is reclaimed as if the host
+// had signaled memory pressure.
+func (l *Loader) resize(cpus uint, totalMem uint64) error {
+	if cpus > 0 {
+		if err := l.k.SetApplicationCores(cpus); err != nil {
+			return fmt.Errorf("changing the number of CPUs: %w", err)
+		}
+		runtime.GOMAXPROCS(int(cpus))
+		log.Infof("CPUs: %d", cpus)
+	}
+	if totalMem > 0 {
+		usage.SetTotalMemory(totalMem)
+		log.Infof("Setting total memory to %.2f GB", float64(totalMem)/(1<<30))
+		l.totalMem = totalMem
+		l.enableOOMKiller()
+		l.k.EnableCacheShrinker(totalMem)
+
+		mf := l.k.MemoryFile()
+		_ = mf.UpdateUsage() // Best effort
+		if _, used := usage.MemoryAccounting.Copy(); used > totalMem {
+			log.Infof("Memory usage %d exceeds new total memory %d, starting evictions", used, totalMem)
+			mf.StartEvictions()
+		}
+	}
+	return nil
+}
+
+// enableOOMKiller limits the memory allocated by the sentry to the total
+// memory of the sandbox if the OOM policy is config.OOMPolicyKill, so that the
+// sentry's OOM killer, rather than the host, kills a process when memory runs
+// out.
+func (l *Loader) enableOOMKiller() {
+	if l.root.conf.OOMPolicy != config.OOMPolicyKill {
+		return
+	}
+	if l.totalMem == 0 {
+		log.Warningf("Total memory is unknown, not enabling the OOM killer")
+		return
+	}
+	l.k.EnableOOMKiller(l.totalMem)
+}
+
+// resizeTTY sets the window size of the TTY attached to the given "tgid"
+// inside container "cid", which notifies its foreground process group.
+func (l *Loader) resizeTTY(cid string, tgid kernel.ThreadID, ws *linux.Winsize) error {
+	l.mu.Lock()
+	tty, err := l.ttyFromIDLocked(execID{cid: cid, pid: tgid})
+	l.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("no thread group found: %w", err)
+	}
+	if tty == nil {
+		return fmt.Errorf("no TTY attached")
+	}
+	return tty.SetWinsize(ws)
+}
+
 // signalAllProcesses that belong to specified container. It's a noop if the
 // container hasn't started or has exited.
 func (l *Loader) signalAllProcesses(cid string, signo int32) error {
@@ -1317,6 +1877,66 @@ func (l *Loader) signalAllProcesses(cid string, signo int32) error {
 	return l.k.SendContainerSignal(cid, &linux.SignalInfo{Signo: signo})
 }
 
+// killAllPollInterval is how often killAllProcesses checks whether the
+// processes it signaled have exited.
+const killAllPollInterval = 10 * gtime.Millisecond
+
+// killAllProcesses sends signo to all processes in the container and waits up
+// to timeout for them to exit. Then it sends SIGKILL to any processes that
+// remain in the container, including ones created after signo was sent. It
+// returns true if SIGKILL had to be sent.
+func (l *Loader) killAllProcesses(cid string, signo int32, timeout gtime.Duration) (bool, error) {
+	// Check that the container has actually started before signaling it.
+	if _, err := l.threadGroupFromID(execID{cid: cid}); err != nil {
+		return false, err
+	}
+	if err := l.signalAllProcesses(cid, signo); err != nil {
+		return false, fmt.Errorf("signaling all processes in container %q: %w", cid, err)
+	}
+
+	deadline := gtime.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := gtime.NewTicker(killAllPollInterval)
+	defer ticker.Stop()
+	for l.k.ContainerHasLiveTasks(cid) {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			// signalAllProcesses pauses the kernel, so any process that
+			// escaped the first signal by being forked since is covered.
+			if err := l.signalAllProcesses(cid, int32(linux.SIGKILL)); err != nil {
+				return true, fmt.Errorf("killing all processes in container %q: %w", cid, err)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// copyContainerFiles calls fn with the root of the mount namespace and the
+// credentials of the init process of container cid.
+func (l *Loader) copyContainerFiles(cid string, fn func(ctx context.Context, creds *auth.Credentials, root vfs.VirtualDentry) error) error {
+	tg, err := l.threadGroupFromID(execID{cid: cid})
+	if err != nil {
+		return err
+	}
+	leader := tg.Leader()
+	if leader == nil {
+		return fmt.Errorf("container %q has stopped", cid)
+	}
+	// task.MountNamespaceVFS2() does not take a ref, so we must do so
+	// ourselves.
+	mns := leader.MountNamespaceVFS2()
+	if mns == nil || !mns.TryIncRef() {
+		return fmt.Errorf("container %q has stopped", cid)
+	}
+	ctx := l.k.SupervisorContext()
+	defer mns.DecRef(ctx)
+	root := mns.Root()
+	defer root.DecRef(ctx)
+	return fn(vfs.WithRoot(ctx, root), leader.Credentials(), root)
+}
+
 // threadGroupFromID is similar to tryThreadGroupFromIDLocked except that it
 // acquires mutex before calling it and fails in case container hasn't started
 // yet.
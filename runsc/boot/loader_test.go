@@ -132,6 +132,10 @@ func createLoader(spec *specs.Spec) (*Loader, func(), error) {
 		GoferFDs:        []int{sandEnd},
 		StdioFDs:        stdio,
 		PodInitConfigFD: -1,
+		MetricServerFD:  -1,
+		ConnectPolicyFD: -1,
+		CompatPolicyFD:  -1,
+		SwapFD:          -1,
 	}
 	l, err := New(args)
 	if err != nil {
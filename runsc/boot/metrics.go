@@ -0,0 +1,165 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/unet"
+)
+
+// metricPrefix is prepended to the names of metrics exported in the
+// Prometheus text exposition format.
+const metricPrefix = "runsc_"
+
+// maxMetricRequestSize is the maximum size of an HTTP request header accepted
+// by the metric server.
+const maxMetricRequestSize = 4096
+
+// MetricSocketPath returns the path of the unix domain socket on which the
+// sandbox with the given ID serves metrics, given the runtime root directory.
+func MetricSocketPath(rootDir, id string) string {
+	return filepath.Join(rootDir, fmt.Sprintf("runsc-sandbox.%s.metrics", id))
+}
+
+// newMetricExporter returns an exporter for the metrics of the sandbox with
+// the given ID.
+func newMetricExporter(id string) *metric.PrometheusExporter {
+	return metric.NewPrometheusExporter(metricPrefix, map[string]string{"container_id": id})
+}
+
+// metricServer serves sentry metrics in the Prometheus text exposition format
+// over HTTP on a unix domain socket. It is deliberately minimal so that the
+// sentry doesn't need a full HTTP server: it serves one request per
+// connection, and only GET requests for "/metrics" (or "/").
+type metricServer struct {
+	socket   *unet.ServerSocket
+	exporter *metric.PrometheusExporter
+
+	// wg waits for the accept loop to terminate.
+	wg sync.WaitGroup
+
+	// req and resp are reused across requests, which are served one at a time.
+	req  [maxMetricRequestSize]byte
+	resp bytes.Buffer
+}
+
+// startMetricServer starts serving metrics on the socket fd, which must be
+// bound but not listening.
+func startMetricServer(fd int, exporter *metric.PrometheusExporter) (*metricServer, error) {
+	socket, err := unet.NewServerSocket(fd)
+	if err != nil {
+		return nil, err
+	}
+	if err := socket.Listen(); err != nil {
+		socket.Close()
+		return nil, err
+	}
+	s := &metricServer{
+		socket:   socket,
+		exporter: exporter,
+	}
+	s.wg.Add(1)
+	go func() { // S/R-SAFE: does not impact state directly.
+		s.serve()
+		s.wg.Done()
+	}()
+	return s, nil
+}
+
+// FD returns the file descriptor that the server is running on.
+func (s *metricServer) FD() int {
+	return s.socket.FD()
+}
+
+// stop stops the server and waits for it to exit.
+func (s *metricServer) stop() {
+	s.socket.Close()
+	s.wg.Wait()
+}
+
+func (s *metricServer) serve() {
+	for {
+		conn, err := s.socket.Accept()
+		if err != nil {
+			return
+		}
+		// Only allow this user and root, as the control server does.
+		ucred, err := conn.GetPeerCred()
+		if err != nil || (int(ucred.Uid) != os.Getuid() && ucred.Uid != 0) {
+			log.Warningf("Metric server rejected connection: %v", err)
+			conn.Close()
+			continue
+		}
+		s.handle(conn)
+		conn.Close()
+	}
+}
+
+// handle serves a single HTTP request on conn.
+func (s *metricServer) handle(conn *unet.Socket) {
+	// Read until the end of the request header. Only the request line is
+	// used.
+	n := 0
+	for n < len(s.req) && !bytes.Contains(s.req[:n], []byte("\r\n\r\n")) {
+		m, err := conn.Read(s.req[n:])
+		if err != nil || m == 0 {
+			return
+		}
+		n += m
+	}
+	line := s.req[:n]
+	if i := bytes.IndexByte(line, '\r'); i >= 0 {
+		line = line[:i]
+	}
+	parts := strings.Fields(string(line))
+	if len(parts) != 3 {
+		s.respond(conn, "400 Bad Request")
+		return
+	}
+	if parts[0] != "GET" {
+		s.respond(conn, "405 Method Not Allowed")
+		return
+	}
+	if parts[1] != "/metrics" && parts[1] != "/" {
+		s.respond(conn, "404 Not Found")
+		return
+	}
+
+	s.resp.Reset()
+	s.resp.WriteString("HTTP/1.0 200 OK\r\nContent-Type: text/plain; version=0.0.4\r\n\r\n")
+	if err := s.exporter.Export(&s.resp); err != nil {
+		log.Warningf("Failed to export metrics: %v", err)
+		s.respond(conn, "500 Internal Server Error")
+		return
+	}
+	if _, err := conn.Write(s.resp.Bytes()); err != nil {
+		log.Debugf("Failed to write metrics: %v", err)
+	}
+}
+
+// respond writes an HTTP response with the given status and no body.
+func (s *metricServer) respond(conn *unet.Socket, status string) {
+	if _, err := conn.Write([]byte("HTTP/1.0 " + status + "\r\n\r\n")); err != nil {
+		log.Debugf("Failed to write metric server response: %v", err)
+	}
+}
@@ -15,11 +15,14 @@
 package boot
 
 import (
+	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/merkletree"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/tmpfs"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/runsc/config"
@@ -116,6 +119,12 @@ func newPodMountHints(spec *specs.Spec) (*podMountHints, error) {
 		if len(m.mount.Type) == 0 {
 			return nil, fmt.Errorf("type field for %q has not been set", m.name)
 		}
+		if m.hostSHM && (m.share != shared || m.mount.Type != bind) {
+			return nil, fmt.Errorf("hostshm for %q requires type %q and share %q", m.name, bind, shared)
+		}
+		if m.verity != "" && (m.share == shared || m.mount.Type != bind) {
+			return nil, fmt.Errorf("verity for %q requires type %q and share other than %q", m.name, bind, shared)
+		}
 
 		// Check for duplicate mount sources.
 		for name2, m2 := range mnts {
@@ -136,6 +145,17 @@ type mountHint struct {
 	share shareType
 	mount specs.Mount
 
+	// hostSHM indicates that the volume is a host directory of shared memory
+	// files, e.g. the host's /dev/shm, that are also mapped by processes
+	// outside the sandbox. Memory mappings of these files always map host
+	// pages, so that they are coherent with other sandboxes.
+	hostSHM bool
+
+	// verity is the hex-encoded root hash of the volume, as printed by "runsc
+	// verity-measure". If set, the volume is mounted read-only, and all files
+	// are verified against the volume's Merkle trees.
+	verity string
+
 	// vfsMount is the master mount for the volume. For mounts with 'pod' share
 	// the master volume is bind mounted inside the containers.
 	vfsMount *vfs.Mount
@@ -158,6 +178,17 @@ func (m *mountHint) setField(key, val string) error {
 		m.share = share
 	case "options":
 		return m.setOptions(val)
+	case "hostshm":
+		hostSHM, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid hostshm value %q: %v", val, err)
+		}
+		m.hostSHM = hostSHM
+	case "verity":
+		if rootHash, err := hex.DecodeString(val); err != nil || len(rootHash) != merkletree.DigestSize {
+			return fmt.Errorf("invalid verity root hash %q", val)
+		}
+		m.verity = val
 	default:
 		return fmt.Errorf("invalid mount annotation: %s=%s", key, val)
 	}
@@ -203,6 +234,11 @@ func (m *mountHint) checkCompatible(replica *specs.Mount) error {
 	if masterOpts.Flags.NoATime && !replicaOpts.Flags.NoATime {
 		return fmt.Errorf("cannot mount atime enabled shared mount because master is noatime, mount: %+v", replica)
 	}
+	// ID mappings apply to the whole filesystem, which the master and its
+	// replicas share.
+	if uids, gids, err := specutils.MountIDMappings(replica); err != nil || len(uids) != 0 || len(gids) != 0 {
+		return fmt.Errorf("cannot mount shared mount with ID mappings, mount: %+v", replica)
+	}
 	return nil
 }
 
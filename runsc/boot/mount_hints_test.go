@@ -33,6 +33,16 @@ func TestPodMountHintsHappy(t *testing.T) {
 			MountPrefix + "mount2.type":    "bind",
 			MountPrefix + "mount2.share":   "container",
 			MountPrefix + "mount2.options": "rw,private",
+
+			MountPrefix + "mount3.source":  "baz",
+			MountPrefix + "mount3.type":    "bind",
+			MountPrefix + "mount3.share":   "shared",
+			MountPrefix + "mount3.hostshm": "true",
+
+			MountPrefix + "mount4.source": "qux",
+			MountPrefix + "mount4.type":   "bind",
+			MountPrefix + "mount4.share":  "pod",
+			MountPrefix + "mount4.verity": "abababababababababababababababababababababababababababababababab",
 		},
 	}
 	podHints, err := newPodMountHints(spec)
@@ -74,6 +84,25 @@ func TestPodMountHintsHappy(t *testing.T) {
 	if want := []string{"rw", "private"}; !reflect.DeepEqual(want, mount2.mount.Options) {
 		t.Errorf("mount2 type, want: %q, got: %q", want, mount2.mount.Options)
 	}
+	if mount2.hostSHM {
+		t.Errorf("mount2 hostshm, want: false, got: true")
+	}
+
+	mount3 := podHints.mounts["mount3"]
+	if want := shared; want != mount3.share {
+		t.Errorf("mount3 type, want: %q, got: %q", want, mount3.share)
+	}
+	if !mount3.hostSHM {
+		t.Errorf("mount3 hostshm, want: true, got: false")
+	}
+	if mount3.verity != "" {
+		t.Errorf("mount3 verity, want: \"\", got: %q", mount3.verity)
+	}
+
+	mount4 := podHints.mounts["mount4"]
+	if want := "abababababababababababababababababababababababababababababababab"; want != mount4.verity {
+		t.Errorf("mount4 verity, want: %q, got: %q", want, mount4.verity)
+	}
 }
 
 func TestPodMountHintsErrors(t *testing.T) {
@@ -164,6 +193,56 @@ func TestPodMountHintsErrors(t *testing.T) {
 			},
 			error: "unknown mount option",
 		},
+		{
+			name: "invalid hostshm",
+			annotations: map[string]string{
+				MountPrefix + "mount1.source":  "foo",
+				MountPrefix + "mount1.type":    "bind",
+				MountPrefix + "mount1.share":   "shared",
+				MountPrefix + "mount1.hostshm": "invalid-bool",
+			},
+			error: "invalid hostshm",
+		},
+		{
+			name: "hostshm not shared",
+			annotations: map[string]string{
+				MountPrefix + "mount1.source":  "foo",
+				MountPrefix + "mount1.type":    "bind",
+				MountPrefix + "mount1.share":   "pod",
+				MountPrefix + "mount1.hostshm": "true",
+			},
+			error: "hostshm for",
+		},
+		{
+			name: "hostshm tmpfs",
+			annotations: map[string]string{
+				MountPrefix + "mount1.source":  "foo",
+				MountPrefix + "mount1.type":    "tmpfs",
+				MountPrefix + "mount1.share":   "shared",
+				MountPrefix + "mount1.hostshm": "true",
+			},
+			error: "hostshm for",
+		},
+		{
+			name: "invalid verity",
+			annotations: map[string]string{
+				MountPrefix + "mount1.source": "foo",
+				MountPrefix + "mount1.type":   "bind",
+				MountPrefix + "mount1.share":  "container",
+				MountPrefix + "mount1.verity": "abcd",
+			},
+			error: "invalid verity",
+		},
+		{
+			name: "verity shared",
+			annotations: map[string]string{
+				MountPrefix + "mount1.source": "foo",
+				MountPrefix + "mount1.type":   "bind",
+				MountPrefix + "mount1.share":  "shared",
+				MountPrefix + "mount1.verity": "abababababababababababababababababababababababababababababababab",
+			},
+			error: "verity for",
+		},
 		{
 			name: "duplicate source",
 			annotations: map[string]string{
@@ -20,16 +20,21 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/hostos"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
 	"gvisor.dev/gvisor/pkg/tcpip/link/fdbased"
 	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
 	"gvisor.dev/gvisor/pkg/tcpip/link/packetsocket"
 	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fifo"
+	"gvisor.dev/gvisor/pkg/tcpip/link/shaper"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.dev/gvisor/pkg/tcpip/link/xdp"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
@@ -68,6 +73,23 @@ var (
 // Network exposes methods that can be used to configure a network stack.
 type Network struct {
 	Stack *stack.Stack
+
+	// Kernel is used to notify the sandboxed application of interfaces
+	// attached to or detached from Stack. It may be nil.
+	Kernel *kernel.Kernel
+
+	// mu serializes AttachNIC, DetachNIC and SetBandwidth.
+	mu sync.Mutex
+
+	// attachedFDs maps the IDs of the NICs created by AttachNIC to the host
+	// FDs owned by their link endpoints.
+	//
+	// +checklocks:mu
+	attachedFDs map[tcpip.NICID][]int
+
+	// dhcp records the configuration leased for links with DHCP. If nil,
+	// it is allocated by CreateLinksAndRoutes when needed.
+	dhcp *dhcpLeases
 }
 
 // Route represents a route in the network stack.
@@ -105,6 +127,23 @@ type FDBasedLink struct {
 	// NumChannels controls how many underlying FDs are to be used to
 	// create this endpoint.
 	NumChannels int
+
+	// DHCP indicates that the link's IPv4 address, routes and DNS servers
+	// are leased with DHCP, in addition to Addresses and Routes.
+	DHCP bool
+
+	// Bandwidth is the initial bandwidth limits of the link.
+	Bandwidth shaper.Limits
+}
+
+// fdbasedNIC is the context of the NICs created for FDBasedLinks.
+type fdbasedNIC struct {
+	// queueStatsEndpoint is the fd-based link endpoint. It is wrapped by the
+	// NIC's link endpoint, so it is kept around for its per-queue stats.
+	queueStatsEndpoint
+
+	// shaper limits the bandwidth of the NIC.
+	shaper *shaper.Endpoint
 }
 
 // XDPLink configures an XDP link.
@@ -132,6 +171,16 @@ type LoopbackLink struct {
 	Routes    []Route
 }
 
+// DummyLink configures a dummy link: a virtual interface with its own name,
+// MTU and addresses that isn't connected to any network. As with Linux dummy
+// interfaces, traffic sent through a dummy link never leaves the stack.
+type DummyLink struct {
+	Name      string
+	MTU       int
+	Addresses []IPWithPrefix
+	Routes    []Route
+}
+
 // CreateLinksAndRoutesArgs are arguments to CreateLinkAndRoutes.
 type CreateLinksAndRoutesArgs struct {
 	// FilePayload contains the fds associated with the FDBasedLinks. The
@@ -142,12 +191,17 @@ type CreateLinksAndRoutesArgs struct {
 	LoopbackLinks []LoopbackLink
 	FDBasedLinks  []FDBasedLink
 	XDPLinks      []XDPLink
+	DummyLinks    []DummyLink
 
 	Defaultv4Gateway DefaultRoute
 	Defaultv6Gateway DefaultRoute
 
 	// PCAP indicates that FilePayload also contains a PCAP log file.
 	PCAP bool
+
+	// DHCPTimeout is the time to wait for the lease of each FDBasedLink with
+	// DHCP.
+	DHCPTimeout time.Duration
 }
 
 // IPWithPrefix is an address with its subnet prefix length.
@@ -206,6 +260,9 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	// Collect routes from all links.
 	var routes []tcpip.Route
 
+	// Addresses are leased for these links once the routes are set up.
+	var dhcpLinks []*dhcpLink
+
 	// Loopback normally appear before other interfaces.
 	for _, link := range args.LoopbackLinks {
 		nicID++
@@ -248,54 +305,18 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			nicID++
 			nicids[link.Name] = nicID
 
-			FDs := make([]int, 0, link.NumChannels)
-			for j := 0; j < link.NumChannels; j++ {
-				// Copy the underlying FD.
-				oldFD := args.FilePayload.Files[fdOffset].Fd()
-				newFD, err := unix.Dup(int(oldFD))
-				if err != nil {
-					return fmt.Errorf("failed to dup FD %v: %v", oldFD, err)
-				}
-				FDs = append(FDs, newFD)
-				fdOffset++
-			}
-
-			mac := tcpip.LinkAddress(link.LinkAddress)
-			log.Infof("gso max size is: %d", link.GSOMaxSize)
-
-			linkEP, err := fdbased.New(&fdbased.Options{
-				FDs:                FDs,
-				MTU:                uint32(link.MTU),
-				EthernetHeader:     mac != "",
-				Address:            mac,
-				PacketDispatchMode: dispatchMode,
-				GSOMaxSize:         link.GSOMaxSize,
-				GvisorGSOEnabled:   link.GvisorGSOEnabled,
-				TXChecksumOffload:  link.TXChecksumOffload,
-				RXChecksumOffload:  link.RXChecksumOffload,
-			})
-			if err != nil {
+			files := args.FilePayload.Files[fdOffset : fdOffset+link.NumChannels]
+			fdOffset += link.NumChannels
+			if _, err := n.createFDBasedNIC(nicID, &link, files, dispatchMode); err != nil {
 				return err
 			}
-
-			// Wrap linkEP in a sniffer to enable packet logging.
-			sniffEP := sniffer.New(packetsocket.New(linkEP))
-
-			var qDisc stack.QueueingDiscipline
-			switch link.QDisc {
-			case config.QDiscNone:
-			case config.QDiscFIFO:
-				log.Infof("Enabling FIFO QDisc on %q", link.Name)
-				qDisc = fifo.New(sniffEP, runtime.GOMAXPROCS(0), 1000)
-			}
-
-			log.Infof("Enabling interface %q with id %d on addresses %+v (%v) w/ %d channels", link.Name, nicID, link.Addresses, mac, link.NumChannels)
-			opts := stack.NICOptions{
-				Name:  link.Name,
-				QDisc: qDisc,
-			}
-			if err := n.createNICWithAddrs(nicID, sniffEP, opts, link.Addresses); err != nil {
-				return err
+			if link.DHCP {
+				dhcpLinks = append(dhcpLinks, &dhcpLink{
+					n:        n,
+					name:     link.Name,
+					nicID:    nicID,
+					linkAddr: tcpip.LinkAddress(link.LinkAddress),
+				})
 			}
 
 			// Collect the routes from this link.
@@ -306,11 +327,6 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 				}
 				routes = append(routes, route)
 			}
-
-			for _, neigh := range link.Neighbors {
-				proto, tcpipAddr := ipToAddressAndProto(neigh.IP)
-				n.Stack.AddStaticNeighbor(nicID, proto, tcpipAddr, tcpip.LinkAddress(neigh.HardwareAddr))
-			}
 		}
 	} else if len(args.XDPLinks) > 0 {
 		if nlinks := len(args.XDPLinks); nlinks > 1 {
@@ -348,6 +364,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			TXChecksumOffload: link.TXChecksumOffload,
 			RXChecksumOffload: link.RXChecksumOffload,
 			InterfaceIndex:    link.InterfaceIndex,
+			SaveRestore:       true,
 		})
 		if err != nil {
 			return err
@@ -402,6 +419,33 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		}
 	}
 
+	// Dummy links are created last so that they don't change the IDs of the
+	// links above, which mirror the host's.
+	for _, link := range args.DummyLinks {
+		if _, ok := nicids[link.Name]; ok {
+			return fmt.Errorf("duplicate interface name %q for dummy link", link.Name)
+		}
+		nicID++
+		nicids[link.Name] = nicID
+
+		linkEP := packetsocket.New(ethernet.New(loopback.NewWithMTU(uint32(link.MTU))))
+
+		log.Infof("Enabling dummy interface %q with id %d on addresses %+v", link.Name, nicID, link.Addresses)
+		opts := stack.NICOptions{Name: link.Name}
+		if err := n.createNICWithAddrs(nicID, linkEP, opts, link.Addresses); err != nil {
+			return err
+		}
+
+		// Collect the routes from this link.
+		for _, r := range link.Routes {
+			route, err := r.toTcpipRoute(nicID)
+			if err != nil {
+				return err
+			}
+			routes = append(routes, route)
+		}
+	}
+
 	if !args.Defaultv4Gateway.Route.Empty() {
 		nicID, ok := nicids[args.Defaultv4Gateway.Name]
 		if !ok {
@@ -428,9 +472,239 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 
 	log.Infof("Setting routes %+v", routes)
 	n.Stack.SetRouteTable(routes)
+	return n.startDHCP(dhcpLinks, args.DHCPTimeout)
+}
+
+// AttachNICArgs are arguments to AttachNIC.
+type AttachNICArgs struct {
+	// FilePayload contains the fds of the link's channels. The number of fds
+	// should match Link.NumChannels.
+	urpc.FilePayload
+
+	Link FDBasedLink
+}
+
+// AttachNIC creates an fd-based link and its routes in a network stack that is
+// already in use, and notifies the sandboxed application of the new interface.
+func (n *Network) AttachNIC(args *AttachNICArgs, _ *struct{}) error {
+	link := &args.Link
+	if link.NumChannels <= 0 {
+		return fmt.Errorf("invalid number of channels %d for interface %q", link.NumChannels, link.Name)
+	}
+	if got := len(args.FilePayload.Files); got != link.NumChannels {
+		return fmt.Errorf("args.FilePayload.Files has %d FDs but we need %d entries based on Link", got, link.NumChannels)
+	}
+	if link.DHCP {
+		return fmt.Errorf("DHCP isn't supported for attached interface %q", link.Name)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var nicID tcpip.NICID
+	for id, info := range n.Stack.NICInfo() {
+		if info.Name == link.Name {
+			return fmt.Errorf("interface %q already exists", link.Name)
+		}
+		if id > nicID {
+			nicID = id
+		}
+		// The bandwidth limits apply to all external interfaces of the
+		// sandbox, including the attached ones.
+		if nic, ok := info.Context.(*fdbasedNIC); ok {
+			link.Bandwidth = nic.shaper.Limits()
+		}
+	}
+	nicID++
+
+	var routes []tcpip.Route
+	for _, r := range link.Routes {
+		route, err := r.toTcpipRoute(nicID)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, route)
+	}
+
+	// Seccomp filters are installed by now, and they don't allow setting up
+	// the PACKET_RX_RING used by PacketMMap dispatch.
+	fds, err := n.createFDBasedNIC(nicID, link, args.FilePayload.Files, fdbased.RecvMMsg)
+	if err != nil {
+		return err
+	}
+	if n.attachedFDs == nil {
+		n.attachedFDs = make(map[tcpip.NICID][]int)
+	}
+	n.attachedFDs[nicID] = fds
+
+	log.Infof("Adding routes %+v", routes)
+	n.Stack.SetRouteTable(insertRoutes(n.Stack.GetRouteTable(), routes))
+
+	if s := n.inetStack(); s != nil {
+		if iface, ok := s.Interfaces()[int32(nicID)]; ok {
+			inet.NotifyInterfaceAdded(s, int32(nicID), iface)
+		}
+	}
 	return nil
 }
 
+// DetachNICArgs are arguments to DetachNIC.
+type DetachNICArgs struct {
+	// Name is the name of the interface to remove.
+	Name string
+}
+
+// DetachNIC removes a NIC and its routes from a network stack that is already
+// in use, and notifies the sandboxed application. Other NICs and the
+// connections using them are not affected.
+func (n *Network) DetachNIC(args *DetachNICArgs, _ *struct{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var (
+		nicID tcpip.NICID
+		found bool
+	)
+	for id, info := range n.Stack.NICInfo() {
+		if info.Name == args.Name {
+			nicID, found = id, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("interface %q not found", args.Name)
+	}
+
+	log.Infof("Removing interface %q with id %d", args.Name, nicID)
+	if s := n.inetStack(); s != nil {
+		// inet.Stack.RemoveInterface also sends the RTM_DELLINK notification.
+		if err := s.RemoveInterface(int32(nicID)); err != nil {
+			return fmt.Errorf("removing interface %q: %v", args.Name, err)
+		}
+	} else if err := n.Stack.RemoveNIC(nicID); err != nil {
+		return fmt.Errorf("RemoveNIC(%d) failed: %v", nicID, err)
+	}
+
+	// Removing the NIC detached its link endpoint, which stopped using the
+	// FDs.
+	closeFDs(n.attachedFDs[nicID])
+	delete(n.attachedFDs, nicID)
+	return nil
+}
+
+// inetStack returns the sentry's view of n.Stack, or nil if n.Kernel is nil.
+func (n *Network) inetStack() inet.Stack {
+	if n.Kernel == nil {
+		return nil
+	}
+	return n.Kernel.RootNetworkNamespace().Stack()
+}
+
+// insertRoutes returns table with routes added. Since the route table is
+// searched in order, routes are added after the existing routes with a
+// non-empty prefix and before the default routes.
+func insertRoutes(table, routes []tcpip.Route) []tcpip.Route {
+	var specific, defaults []tcpip.Route
+	for _, rs := range [][]tcpip.Route{table, routes} {
+		for _, r := range rs {
+			if r.Destination.Prefix() == 0 {
+				defaults = append(defaults, r)
+			} else {
+				specific = append(specific, r)
+			}
+		}
+	}
+	return append(specific, defaults...)
+}
+
+// createFDBasedNIC creates a NIC with the given ID for link, whose channels are
+// backed by copies of files. It returns the copied FDs, which are owned by the
+// NIC's link endpoint.
+func (n *Network) createFDBasedNIC(nicID tcpip.NICID, link *FDBasedLink, files []*os.File, dispatchMode fdbased.PacketDispatchMode) ([]int, error) {
+	FDs := make([]int, 0, len(files))
+	for _, f := range files {
+		// Copy the underlying FD.
+		oldFD := f.Fd()
+		newFD, err := unix.Dup(int(oldFD))
+		if err != nil {
+			closeFDs(FDs)
+			return nil, fmt.Errorf("failed to dup FD %v: %v", oldFD, err)
+		}
+		FDs = append(FDs, newFD)
+	}
+
+	mac := tcpip.LinkAddress(link.LinkAddress)
+	log.Infof("gso max size is: %d", link.GSOMaxSize)
+
+	linkEP, err := fdbased.New(&fdbased.Options{
+		FDs:                FDs,
+		MTU:                uint32(link.MTU),
+		EthernetHeader:     mac != "",
+		Address:            mac,
+		PacketDispatchMode: dispatchMode,
+		GSOMaxSize:         link.GSOMaxSize,
+		GvisorGSOEnabled:   link.GvisorGSOEnabled,
+		TXChecksumOffload:  link.TXChecksumOffload,
+		RXChecksumOffload:  link.RXChecksumOffload,
+		// Connections are reconnected on restore, or reset if they can't be.
+		SaveRestore: true,
+	})
+	if err != nil {
+		closeFDs(FDs)
+		return nil, err
+	}
+
+	// Limit the bandwidth below the packet sockets and sniffer, so that they
+	// see packets when the application would.
+	if link.Bandwidth != (shaper.Limits{}) {
+		log.Infof("Limiting bandwidth of %q to %+v", link.Name, link.Bandwidth)
+	}
+	shaperEP := shaper.New(linkEP, shaper.Options{
+		Limits: link.Bandwidth,
+		Clock:  n.Stack.Clock(),
+	})
+
+	// Wrap linkEP in a sniffer to enable packet logging.
+	sniffEP := sniffer.New(packetsocket.New(shaperEP))
+
+	var qDisc stack.QueueingDiscipline
+	switch link.QDisc {
+	case config.QDiscNone:
+	case config.QDiscFIFO:
+		log.Infof("Enabling FIFO QDisc on %q", link.Name)
+		qDisc = fifo.New(sniffEP, runtime.GOMAXPROCS(0), 1000)
+	}
+
+	log.Infof("Enabling interface %q with id %d on addresses %+v (%v) w/ %d channels", link.Name, nicID, link.Addresses, mac, len(files))
+	opts := stack.NICOptions{
+		Name:  link.Name,
+		QDisc: qDisc,
+		Context: &fdbasedNIC{
+			queueStatsEndpoint: linkEP.(queueStatsEndpoint),
+			shaper:             shaperEP,
+		},
+	}
+	if err := n.createNICWithAddrs(nicID, sniffEP, opts, link.Addresses); err != nil {
+		// The NIC may have been created before adding an address failed.
+		n.Stack.RemoveNIC(nicID)
+		closeFDs(FDs)
+		return nil, err
+	}
+
+	for _, neigh := range link.Neighbors {
+		proto, tcpipAddr := ipToAddressAndProto(neigh.IP)
+		n.Stack.AddStaticNeighbor(nicID, proto, tcpipAddr, tcpip.LinkAddress(neigh.HardwareAddr))
+	}
+	return FDs, nil
+}
+
+// closeFDs closes all FDs in fds.
+func closeFDs(fds []int) {
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+}
+
 // createNICWithAddrs creates a NIC in the network stack and adds the given
 // addresses.
 func (n *Network) createNICWithAddrs(id tcpip.NICID, ep stack.LinkEndpoint, opts stack.NICOptions, addrs []IPWithPrefix) error {
@@ -475,3 +749,37 @@ func ipToAddress(ip net.IP) tcpip.Address {
 func ipMaskToAddressMask(ipMask net.IPMask) tcpip.AddressMask {
 	return tcpip.AddressMask(ipToAddress(net.IP(ipMask)))
 }
+
+// parseNetmaskRewrites parses the value of the --netmask-rewrite flag, a
+// comma-separated list of old=new subnet pairs in CIDR notation, e.g.
+// "10.0.0.0/24=10.1.0.0/24".
+func parseNetmaskRewrites(value string) ([]stack.SubnetRewrite, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var rewrites []stack.SubnetRewrite
+	for _, mapping := range strings.Split(value, ",") {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid netmask rewrite %q: must be of the form old=new", mapping)
+		}
+		var subnets [2]tcpip.Subnet
+		var prefixes [2]int
+		for i, part := range parts {
+			_, ipNet, err := net.ParseCIDR(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid netmask rewrite %q: %w", mapping, err)
+			}
+			subnets[i], err = tcpip.NewSubnet(ipToAddress(ipNet.IP), ipMaskToAddressMask(ipNet.Mask))
+			if err != nil {
+				return nil, fmt.Errorf("invalid netmask rewrite %q: %v", mapping, err)
+			}
+			prefixes[i], _ = ipNet.Mask.Size()
+		}
+		if len(subnets[0].ID()) != len(subnets[1].ID()) || prefixes[0] != prefixes[1] {
+			return nil, fmt.Errorf("invalid netmask rewrite %q: subnets must have the same address family and prefix length", mapping)
+		}
+		rewrites = append(rewrites, stack.SubnetRewrite{Old: subnets[0], New: subnets[1]})
+	}
+	return rewrites, nil
+}
@@ -0,0 +1,366 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/fdbased"
+	"gvisor.dev/gvisor/pkg/tcpip/link/shaper"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+// NetworkStatsOut is a snapshot of the counters and state of a network stack,
+// as dumped by "runsc debug --network".
+//
+// Counters are reported as trees of maps keyed by the names of the fields of
+// the netstack stats structs (e.g. Stack["TCP"]["ActiveConnectionOpenings"]),
+// whose leaves are the values of the corresponding tcpip.StatCounters.
+type NetworkStatsOut struct {
+	// Stack holds the stack-wide counters from tcpip.Stats.
+	Stack map[string]interface{} `json:"stack"`
+
+	// NICs holds the state and counters of each NIC, keyed by NIC name.
+	NICs map[string]NICStats `json:"nics"`
+
+	// Routes is the forwarding table.
+	Routes []RouteStats `json:"routes"`
+
+	// TCPEndpoints holds the state of connected TCP endpoints.
+	TCPEndpoints []TCPEndpointStats `json:"tcpEndpoints"`
+}
+
+// NICStats is the state and counters of a single NIC.
+type NICStats struct {
+	ID          tcpip.NICID `json:"id"`
+	LinkAddress string      `json:"linkAddress"`
+	Addresses   []string    `json:"addresses"`
+	MTU         uint32      `json:"mtu"`
+
+	// Flags is the state of the NIC.
+	Flags stack.NICStateFlags `json:"flags"`
+
+	// Forwarding holds the forwarding status of each network protocol,
+	// keyed by protocol name.
+	Forwarding map[string]bool `json:"forwarding"`
+
+	// Stats holds the NIC's counters from tcpip.NICStats.
+	Stats map[string]interface{} `json:"stats"`
+
+	// NetworkStats holds the counters of each network endpoint bound to the
+	// NIC, keyed by protocol name.
+	NetworkStats map[string]map[string]interface{} `json:"networkStats"`
+
+	// Neighbors is the content of the NIC's neighbor cache.
+	Neighbors []NeighborStats `json:"neighbors"`
+
+	// Queues holds the counters of each queue of the NIC's link endpoint,
+	// for endpoints with multiple queues (e.g. fdbased).
+	Queues []map[string]interface{} `json:"queues,omitempty"`
+
+	// Bandwidth is the bandwidth limits of the NIC, for NICs whose bandwidth
+	// can be limited (e.g. fdbased).
+	Bandwidth *shaper.Limits `json:"bandwidth,omitempty"`
+
+	// Shaper holds the counters of the packets queued and dropped in each
+	// direction to enforce Bandwidth.
+	Shaper map[string]interface{} `json:"shaper,omitempty"`
+}
+
+// queueStatsEndpoint is a link endpoint that keeps per-queue counters.
+type queueStatsEndpoint interface {
+	QueueStats() []*fdbased.QueueStats
+}
+
+// NeighborStats is an entry of a neighbor cache.
+type NeighborStats struct {
+	Address     string `json:"address"`
+	LinkAddress string `json:"linkAddress"`
+	State       string `json:"state"`
+}
+
+// RouteStats is an entry of the forwarding table.
+type RouteStats struct {
+	Destination string      `json:"destination"`
+	Gateway     string      `json:"gateway,omitempty"`
+	NIC         tcpip.NICID `json:"nic"`
+}
+
+// TCPEndpointStats is the state of a connected TCP endpoint.
+type TCPEndpointStats struct {
+	LocalAddress  string `json:"localAddress"`
+	RemoteAddress string `json:"remoteAddress"`
+	State         string `json:"state"`
+
+	// SendQueueSize and RecvQueueSize are the number of bytes in the send
+	// and receive queues.
+	SendQueueSize int `json:"sendQueueSize"`
+	RecvQueueSize int `json:"recvQueueSize"`
+
+	// Info is the endpoint's TCP_INFO.
+	Info tcpip.TCPInfoOption `json:"info"`
+}
+
+// Stats dumps the counters and state of the network stack.
+func (n *Network) Stats(_ *struct{}, out *NetworkStatsOut) error {
+	stats := n.Stack.Stats()
+	*out = NetworkStatsOut{
+		Stack: statCountersToMap(reflect.ValueOf(&stats).Elem()),
+		NICs:  make(map[string]NICStats),
+	}
+
+	for id, info := range n.Stack.NICInfo() {
+		nic := NICStats{
+			ID:           id,
+			LinkAddress:  info.LinkAddress.String(),
+			MTU:          info.MTU,
+			Flags:        info.Flags,
+			Forwarding:   make(map[string]bool),
+			Stats:        statCountersToMap(reflect.ValueOf(&info.Stats).Elem()),
+			NetworkStats: make(map[string]map[string]interface{}),
+		}
+		for _, addr := range info.ProtocolAddresses {
+			nic.Addresses = append(nic.Addresses, addr.AddressWithPrefix.String())
+		}
+		if ep, ok := info.Context.(queueStatsEndpoint); ok {
+			for _, q := range ep.QueueStats() {
+				nic.Queues = append(nic.Queues, statCountersToMap(reflect.ValueOf(q).Elem()))
+			}
+		}
+		if ctx, ok := info.Context.(*fdbasedNIC); ok {
+			limits := ctx.shaper.Limits()
+			nic.Bandwidth = &limits
+			nic.Shaper = statCountersToMap(reflect.ValueOf(ctx.shaper.Stats()).Elem())
+		}
+		for proto, enabled := range info.Forwarding {
+			nic.Forwarding[networkProtocolName(proto)] = enabled
+		}
+		for proto, s := range info.NetworkStats {
+			if v := reflect.ValueOf(s); v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+				nic.NetworkStats[networkProtocolName(proto)] = statCountersToMap(v.Elem())
+			}
+		}
+		for _, proto := range []tcpip.NetworkProtocolNumber{ipv4.ProtocolNumber, ipv6.ProtocolNumber} {
+			// Only NICs that perform link address resolution for proto have
+			// a neighbor cache.
+			neighbors, err := n.Stack.Neighbors(id, proto)
+			if err != nil {
+				continue
+			}
+			for _, neigh := range neighbors {
+				nic.Neighbors = append(nic.Neighbors, NeighborStats{
+					Address:     neigh.Addr.String(),
+					LinkAddress: neigh.LinkAddr.String(),
+					State:       neigh.State.String(),
+				})
+			}
+		}
+		out.NICs[info.Name] = nic
+	}
+
+	for _, r := range n.Stack.GetRouteTable() {
+		route := RouteStats{
+			Destination: r.Destination.String(),
+			NIC:         r.NIC,
+		}
+		if len(r.Gateway) != 0 {
+			route.Gateway = r.Gateway.String()
+		}
+		out.Routes = append(out.Routes, route)
+	}
+
+	for _, te := range n.Stack.RegisteredEndpoints() {
+		ep, ok := te.(tcpip.Endpoint)
+		if !ok {
+			continue
+		}
+		info, ok := ep.Info().(*stack.TransportEndpointInfo)
+		if !ok || info.TransProto != tcp.ProtocolNumber {
+			continue
+		}
+		state := tcp.EndpointState(ep.State())
+		if !tcpConnected(state) {
+			continue
+		}
+		s := TCPEndpointStats{
+			LocalAddress:  fullAddressString(info.ID.LocalAddress, info.ID.LocalPort),
+			RemoteAddress: fullAddressString(info.ID.RemoteAddress, info.ID.RemotePort),
+			State:         state.String(),
+		}
+		// Errors are ignored, since the endpoint may be closed concurrently.
+		s.SendQueueSize, _ = ep.GetSockOptInt(tcpip.SendQueueSizeOption)
+		s.RecvQueueSize, _ = ep.GetSockOptInt(tcpip.ReceiveQueueSizeOption)
+		_ = ep.GetSockOpt(&s.Info)
+		out.TCPEndpoints = append(out.TCPEndpoints, s)
+	}
+
+	return nil
+}
+
+// ConnTrackOut is a snapshot of the connection tracking table used for NAT,
+// as dumped by "runsc debug --conntrack".
+type ConnTrackOut struct {
+	// Count is the number of tracked connections.
+	Count int `json:"count"`
+
+	// Max is the maximum number of tracked connections, or 0 if it is
+	// unlimited.
+	Max int `json:"max"`
+
+	Entries []ConnTrackEntryStats `json:"entries"`
+}
+
+// ConnTrackEntryStats is a tracked connection.
+type ConnTrackEntryStats struct {
+	Network   string `json:"network"`
+	Transport string `json:"transport"`
+
+	// Original and Reply are the source and destination addresses of
+	// packets in each direction, e.g. "10.0.0.1:1234 -> 10.0.0.2:80". The
+	// reply addresses reflect NAT.
+	Original string `json:"original"`
+	Reply    string `json:"reply"`
+
+	// State is the state of a TCP connection, e.g. "ESTABLISHED".
+	State string `json:"state,omitempty"`
+
+	// TimeoutSeconds is the number of seconds left before the connection
+	// expires unless it sees another packet.
+	TimeoutSeconds int64 `json:"timeoutSeconds"`
+}
+
+// ConnTrack dumps the connection tracking table.
+func (n *Network) ConnTrack(_ *struct{}, out *ConnTrackOut) error {
+	ct := n.Stack.IPTables().ConnTrack()
+	*out = ConnTrackOut{
+		Count: ct.Count(),
+		Max:   ct.Max(),
+	}
+	for _, e := range ct.Entries() {
+		out.Entries = append(out.Entries, ConnTrackEntryStats{
+			Network:        networkProtocolName(e.Original.NetProto),
+			Transport:      transportProtocolName(e.Original.TransProto),
+			Original:       connTrackTupleString(e.Original),
+			Reply:          connTrackTupleString(e.Reply),
+			State:          e.State,
+			TimeoutSeconds: int64(e.Timeout.Seconds()),
+		})
+	}
+	return nil
+}
+
+// connTrackTupleString formats t like "10.0.0.1:1234 -> 10.0.0.2:80".
+func connTrackTupleString(t stack.ConnTrackTuple) string {
+	return fmt.Sprintf("%s -> %s", fullAddressString(t.SrcAddr, t.SrcPort), fullAddressString(t.DstAddr, t.DstPort))
+}
+
+// statCountersToMap returns a tree of maps keyed by the exported field names
+// of the struct v, whose leaves are the values of its tcpip.StatCounters.
+//
+// Preconditions: v is an addressable struct.
+func statCountersToMap(v reflect.Value) map[string]interface{} {
+	m := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		name := t.Field(i).Name
+		f := v.Field(i)
+		switch c := f.Addr().Interface().(type) {
+		case *tcpip.StatCounter:
+			m[name] = c.Value()
+		case **tcpip.StatCounter:
+			if *c != nil {
+				m[name] = (*c).Value()
+			}
+		case **tcpip.IntegralStatCounterMap:
+			if *c != nil {
+				counts := make(map[string]uint64)
+				for _, key := range (*c).Keys() {
+					if counter, ok := (*c).Get(key); ok {
+						counts[strconv.FormatUint(key, 10)] = counter.Value()
+					}
+				}
+				m[name] = counts
+			}
+		default:
+			switch f.Kind() {
+			case reflect.Struct:
+				m[name] = statCountersToMap(f)
+			case reflect.Ptr:
+				if !f.IsNil() && f.Elem().Kind() == reflect.Struct {
+					m[name] = statCountersToMap(f.Elem())
+				}
+			}
+		}
+	}
+	return m
+}
+
+// tcpConnected returns true if a TCP endpoint in state has an established
+// connection, like EndpointState.connected in the tcp package.
+func tcpConnected(state tcp.EndpointState) bool {
+	switch state {
+	case tcp.StateEstablished, tcp.StateFinWait1, tcp.StateFinWait2, tcp.StateTimeWait, tcp.StateCloseWait, tcp.StateLastAck, tcp.StateClosing:
+		return true
+	default:
+		return false
+	}
+}
+
+// networkProtocolName returns the name of the network protocol proto.
+func networkProtocolName(proto tcpip.NetworkProtocolNumber) string {
+	switch proto {
+	case ipv4.ProtocolNumber:
+		return "ipv4"
+	case ipv6.ProtocolNumber:
+		return "ipv6"
+	default:
+		return strconv.Itoa(int(proto))
+	}
+}
+
+// transportProtocolName returns the name of the transport protocol proto.
+func transportProtocolName(proto tcpip.TransportProtocolNumber) string {
+	switch proto {
+	case tcp.ProtocolNumber:
+		return "tcp"
+	case udp.ProtocolNumber:
+		return "udp"
+	case icmp.ProtocolNumber4:
+		return "icmp"
+	case icmp.ProtocolNumber6:
+		return "icmpv6"
+	default:
+		return strconv.Itoa(int(proto))
+	}
+}
+
+// fullAddressString formats addr and port like "10.0.0.1:80" or "[::1]:80".
+func fullAddressString(addr tcpip.Address, port uint16) string {
+	if len(addr) == 16 {
+		return fmt.Sprintf("[%s]:%d", addr, port)
+	}
+	return fmt.Sprintf("%s:%d", addr, port)
+}
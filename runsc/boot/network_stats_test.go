@@ -0,0 +1,138 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/fdbased"
+	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+)
+
+func TestNetworkStats(t *testing.T) {
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol},
+	})
+	defer s.Close()
+
+	const nicID = 1
+	if err := s.CreateNICWithOptions(nicID, loopback.New(), stack.NICOptions{Name: "lo"}); err != nil {
+		t.Fatalf("CreateNICWithOptions(%d, _, _): %s", nicID, err)
+	}
+	addr := tcpip.ProtocolAddress{
+		Protocol: ipv4.ProtocolNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   tcpip.Address("\x7f\x00\x00\x01"),
+			PrefixLen: 8,
+		},
+	}
+	if err := s.AddProtocolAddress(nicID, addr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, addr, err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: addr.AddressWithPrefix.Subnet(), NIC: nicID}})
+	s.Stats().TCP.ActiveConnectionOpenings.IncrementBy(3)
+
+	n := Network{Stack: s}
+	var out NetworkStatsOut
+	if err := n.Stats(nil, &out); err != nil {
+		t.Fatalf("Stats(): %v", err)
+	}
+
+	tcpStats, ok := out.Stack["TCP"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("TCP stats missing or of unexpected type: %+v", out.Stack)
+	}
+	if got, want := tcpStats["ActiveConnectionOpenings"], uint64(3); got != want {
+		t.Errorf("TCP.ActiveConnectionOpenings = %v, want %d", got, want)
+	}
+
+	nic, ok := out.NICs["lo"]
+	if !ok {
+		t.Fatalf("NIC lo missing: %+v", out.NICs)
+	}
+	if nic.ID != nicID {
+		t.Errorf("NIC ID = %d, want %d", nic.ID, nicID)
+	}
+	if want := "127.0.0.1/8"; len(nic.Addresses) != 1 || nic.Addresses[0] != want {
+		t.Errorf("NIC addresses = %v, want [%s]", nic.Addresses, want)
+	}
+	if _, ok := nic.Stats["Tx"]; !ok {
+		t.Errorf("NIC Tx stats missing: %+v", nic.Stats)
+	}
+	if _, ok := nic.NetworkStats["ipv4"]; !ok {
+		t.Errorf("NIC ipv4 stats missing: %+v", nic.NetworkStats)
+	}
+
+	if len(out.Routes) != 1 || out.Routes[0].Destination != "127.0.0.0/8" || out.Routes[0].NIC != nicID {
+		t.Errorf("Routes = %+v, want a single route to 127.0.0.0/8 via NIC %d", out.Routes, nicID)
+	}
+
+	if _, err := json.Marshal(&out); err != nil {
+		t.Errorf("json.Marshal(): %v", err)
+	}
+}
+
+func TestNetworkStatsQueues(t *testing.T) {
+	const numQueues = 2
+	var fds []int
+	for i := 0; i < numQueues; i++ {
+		pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+		if err != nil {
+			t.Fatalf("Socketpair(): %v", err)
+		}
+		defer unix.Close(pair[0])
+		defer unix.Close(pair[1])
+		fds = append(fds, pair[0])
+	}
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+	})
+	defer s.Close()
+
+	ep, err := fdbased.New(&fdbased.Options{FDs: fds, MTU: 1500})
+	if err != nil {
+		t.Fatalf("fdbased.New(): %v", err)
+	}
+
+	const nicID = 1
+	if err := s.CreateNICWithOptions(nicID, ep, stack.NICOptions{Name: "eth0", Context: ep}); err != nil {
+		t.Fatalf("CreateNICWithOptions(%d, _, _): %s", nicID, err)
+	}
+
+	n := Network{Stack: s}
+	var out NetworkStatsOut
+	if err := n.Stats(nil, &out); err != nil {
+		t.Fatalf("Stats(): %v", err)
+	}
+	nic, ok := out.NICs["eth0"]
+	if !ok {
+		t.Fatalf("NIC eth0 missing: %+v", out.NICs)
+	}
+	if len(nic.Queues) != numQueues {
+		t.Fatalf("got %d queues, want %d: %+v", len(nic.Queues), numQueues, nic.Queues)
+	}
+	for i, q := range nic.Queues {
+		if got, want := q["RxPackets"], uint64(0); got != want {
+			t.Errorf("queue %d RxPackets = %v, want %d", i, got, want)
+		}
+	}
+}
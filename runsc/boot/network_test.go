@@ -0,0 +1,147 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/urpc"
+)
+
+func TestAttachDetachNIC(t *testing.T) {
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+	})
+	defer s.Close()
+
+	const loNICID = 1
+	if err := s.CreateNICWithOptions(loNICID, loopback.New(), stack.NICOptions{Name: "lo"}); err != nil {
+		t.Fatalf("CreateNICWithOptions(%d, _, _): %s", loNICID, err)
+	}
+	defaultRoute := tcpip.Route{Destination: ipv4Subnet(t, "\x00\x00\x00\x00", "\x00\x00\x00\x00"), NIC: loNICID}
+	s.SetRouteTable([]tcpip.Route{defaultRoute})
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Fatalf("Socketpair(): %v", err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "nic")
+	defer f.Close()
+	defer unix.Close(fds[1])
+
+	n := Network{Stack: s}
+	args := AttachNICArgs{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+		Link: FDBasedLink{
+			Name:        "net1",
+			MTU:         1500,
+			NumChannels: 1,
+			Addresses:   []IPWithPrefix{{Address: net.IPv4(192, 168, 1, 2), PrefixLen: 24}},
+			Routes: []Route{{
+				Destination: net.IPNet{IP: net.IPv4(192, 168, 1, 0), Mask: net.IPv4Mask(255, 255, 255, 0)},
+			}},
+		},
+	}
+	if err := n.AttachNIC(&args, nil); err != nil {
+		t.Fatalf("AttachNIC(): %v", err)
+	}
+
+	var nicID tcpip.NICID
+	for id, info := range s.NICInfo() {
+		if info.Name == "net1" {
+			nicID = id
+		}
+	}
+	if nicID == 0 || nicID == loNICID {
+		t.Fatalf("NIC net1 has ID %d, want a new NIC", nicID)
+	}
+	if addr, err := s.GetMainNICAddress(nicID, ipv4.ProtocolNumber); err != nil || addr.Address != tcpip.Address("\xc0\xa8\x01\x02") {
+		t.Errorf("GetMainNICAddress(%d) = %s, %v, want 192.168.1.2", nicID, addr, err)
+	}
+	// The route of net1 must come before the default route, since the route
+	// table is searched in order.
+	routes := s.GetRouteTable()
+	if len(routes) != 2 || routes[0].NIC != nicID || routes[1] != defaultRoute {
+		t.Errorf("GetRouteTable() = %+v, want the route via NIC %d followed by %+v", routes, nicID, defaultRoute)
+	}
+
+	if err := n.AttachNIC(&args, nil); err == nil {
+		t.Errorf("AttachNIC() with a duplicate name succeeded")
+	}
+
+	if err := n.DetachNIC(&DetachNICArgs{Name: "net1"}, nil); err != nil {
+		t.Fatalf("DetachNIC(): %v", err)
+	}
+	if _, ok := s.NICInfo()[nicID]; ok {
+		t.Errorf("NIC %d still exists after DetachNIC()", nicID)
+	}
+	if _, ok := s.NICInfo()[loNICID]; !ok {
+		t.Errorf("NIC %d was removed by DetachNIC()", loNICID)
+	}
+	if routes := s.GetRouteTable(); len(routes) != 1 || routes[0] != defaultRoute {
+		t.Errorf("GetRouteTable() = %+v, want [%+v]", routes, defaultRoute)
+	}
+	if err := n.DetachNIC(&DetachNICArgs{Name: "net1"}, nil); err == nil {
+		t.Errorf("DetachNIC() of a removed NIC succeeded")
+	}
+}
+
+// ipv4Subnet returns the subnet with the given IPv4 address and mask.
+func ipv4Subnet(t *testing.T, addr, mask string) tcpip.Subnet {
+	t.Helper()
+	subnet, err := tcpip.NewSubnet(tcpip.Address(addr), tcpip.AddressMask(mask))
+	if err != nil {
+		t.Fatalf("NewSubnet(%q, %q): %v", addr, mask, err)
+	}
+	return subnet
+}
+
+func TestParseNetmaskRewrites(t *testing.T) {
+	rewrites, err := parseNetmaskRewrites("10.0.0.0/24=10.1.0.0/24,fd00::/64=fd01::/64")
+	if err != nil {
+		t.Fatalf("parseNetmaskRewrites(): %v", err)
+	}
+	if len(rewrites) != 2 {
+		t.Fatalf("parseNetmaskRewrites() returned %d rewrites, want 2", len(rewrites))
+	}
+	want := stack.SubnetRewrite{
+		Old: ipv4Subnet(t, "\x0a\x00\x00\x00", "\xff\xff\xff\x00"),
+		New: ipv4Subnet(t, "\x0a\x01\x00\x00", "\xff\xff\xff\x00"),
+	}
+	if rewrites[0] != want {
+		t.Errorf("parseNetmaskRewrites()[0] = %v, want %v", rewrites[0], want)
+	}
+	if got := rewrites[1].New.Prefix(); got != 64 {
+		t.Errorf("parseNetmaskRewrites()[1] has prefix length %d, want 64", got)
+	}
+
+	for _, value := range []string{
+		"10.0.0.0/24",
+		"10.0.0.0/24=10.1.0.0/16",
+		"10.0.0.0/24=fd00::/24",
+		"10.0.0.0=10.1.0.0",
+	} {
+		if _, err := parseNetmaskRewrites(value); err == nil {
+			t.Errorf("parseNetmaskRewrites(%q) succeeded, want error", value)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// FDsDumpRecord is a single line of the output of DumpFDs. Exactly one of its
+// fields is set.
+type FDsDumpRecord struct {
+	Task   *TaskFilesInfo `json:"task,omitempty"`
+	Mounts *MountsInfo    `json:"mounts,omitempty"`
+	FD     *FDDetails     `json:"fd,omitempty"`
+}
+
+// TaskFilesInfo contains the filesystem state of one task.
+type TaskFilesInfo struct {
+	// PID is the thread group ID of the task in the root PID namespace.
+	PID int32 `json:"pid"`
+	// TID is the thread ID of the task in the root PID namespace.
+	TID int32 `json:"tid"`
+	// Comm is the task's name.
+	Comm string `json:"comm,omitempty"`
+	// CWD is the task's working directory.
+	CWD string `json:"cwd,omitempty"`
+	// Root is the task's root directory, relative to the root of its mount
+	// namespace.
+	Root string `json:"root,omitempty"`
+	// MountNamespace identifies the task's mount namespace. It is the ID of
+	// the namespace's root mount, as shown in /proc/[pid]/mountinfo.
+	MountNamespace uint64 `json:"mount_namespace"`
+	// FDTableOwner is set if the task shares its FD table with a task that
+	// was dumped earlier, and is the TID of that task. The FDs of a shared
+	// table are only dumped once.
+	FDTableOwner int32 `json:"fd_table_owner,omitempty"`
+}
+
+// MountsInfo contains the mount table of one mount namespace. It is dumped
+// before the first task in that mount namespace.
+type MountsInfo struct {
+	// MountNamespace identifies the mount namespace, see
+	// TaskFilesInfo.MountNamespace.
+	MountNamespace uint64 `json:"mount_namespace"`
+	// MountInfo contains the lines of /proc/[pid]/mountinfo for a task whose
+	// root is the root of the mount namespace.
+	MountInfo []string `json:"mountinfo"`
+}
+
+// SocketDetails describes the endpoint of a socket FD.
+type SocketDetails struct {
+	Family   int    `json:"family"`
+	Type     int    `json:"type"`
+	Protocol int    `json:"protocol"`
+	State    uint32 `json:"state"`
+	Local    string `json:"local,omitempty"`
+	Peer     string `json:"peer,omitempty"`
+}
+
+// FDDetails describes one entry in an FD table.
+type FDDetails struct {
+	// TID is the TID of the task owning the FD table, see TaskFilesInfo.TID.
+	TID int32 `json:"tid"`
+	// Number is the FD number.
+	Number int32 `json:"number"`
+	// Type is the file type, e.g. "regular", "socket" or "anon".
+	Type string `json:"type"`
+	// Path is the path of the file, relative to the root of the mount
+	// namespace.
+	Path string `json:"path,omitempty"`
+	// Filesystem is the name of the type of the filesystem containing the
+	// file.
+	Filesystem string `json:"filesystem,omitempty"`
+	// Inode is the file's inode number.
+	Inode uint64 `json:"inode,omitempty"`
+	// Socket describes the endpoint if the file is a socket.
+	Socket *SocketDetails `json:"socket,omitempty"`
+	// Flags are the file status flags, as returned by F_GETFL.
+	Flags uint32 `json:"flags"`
+	// CloseOnExec is true if FD_CLOEXEC is set on the FD.
+	CloseOnExec bool `json:"cloexec,omitempty"`
+	// Offset is the file offset, if the file is seekable.
+	Offset *int64 `json:"offset,omitempty"`
+	// Refs is the number of references held on the file description, e.g. by
+	// other FDs dup'd from it or by memory mappings.
+	Refs int64 `json:"refs"`
+}
+
+// DumpFDs writes the FD tables, mount tables, working directory and root
+// directory of every task in k to w. The output is a stream of JSON objects,
+// one FDsDumpRecord per line, so that large FD tables never need to be held
+// in memory at once.
+func DumpFDs(w io.Writer, k *kernel.Kernel) error {
+	enc := json.NewEncoder(w)
+	pidns := k.TaskSet().Root
+	fdTables := make(map[*kernel.FDTable]int32)
+	mntnses := make(map[uint64]struct{})
+	for _, t := range pidns.Tasks() {
+		tid := int32(pidns.IDOfTask(t))
+		if tid == 0 {
+			// The task exited since Tasks() returned.
+			continue
+		}
+		if err := dumpTaskFDs(enc, t, pidns, tid, fdTables, mntnses); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dumpTaskFDs(enc *json.Encoder, t *kernel.Task, pidns *kernel.PIDNamespace, tid int32, fdTables map[*kernel.FDTable]int32, mntnses map[uint64]struct{}) error {
+	ctx := t.AsyncContext()
+
+	var (
+		fdTable *kernel.FDTable
+		fsc     *kernel.FSContext
+	)
+	t.WithMuLocked(func(t *kernel.Task) {
+		if fdTable = t.FDTable(); fdTable != nil && !fdTable.TryIncRef() {
+			fdTable = nil
+		}
+		if fsc = t.FSContext(); fsc != nil && !fsc.TryIncRef() {
+			fsc = nil
+		}
+	})
+	if fdTable != nil {
+		defer fdTable.DecRef(ctx)
+	}
+	if fsc != nil {
+		defer fsc.DecRef(ctx)
+	}
+	mntns := t.MountNamespaceVFS2()
+	if fdTable == nil || fsc == nil || mntns == nil || !mntns.TryIncRef() {
+		// The task is exiting.
+		return nil
+	}
+	defer mntns.DecRef(ctx)
+
+	realRoot := mntns.Root()
+	mntnsID := realRoot.Mount().ID
+	info := TaskFilesInfo{
+		PID:            int32(pidns.IDOfThreadGroup(t.ThreadGroup())),
+		TID:            tid,
+		Comm:           t.Name(),
+		MountNamespace: mntnsID,
+	}
+	vfsObj := t.Kernel().VFS()
+	if cwd := fsc.WorkingDirectoryVFS2(); cwd.Ok() {
+		info.CWD = pathname(ctx, vfsObj, realRoot, cwd, tid)
+		cwd.DecRef(ctx)
+	}
+	if root := fsc.RootDirectoryVFS2(); root.Ok() {
+		info.Root = pathname(ctx, vfsObj, realRoot, root, tid)
+		root.DecRef(ctx)
+	}
+	owner, shared := fdTables[fdTable]
+	if shared {
+		info.FDTableOwner = owner
+	} else {
+		fdTables[fdTable] = tid
+	}
+
+	if _, ok := mntnses[mntnsID]; !ok {
+		mntnses[mntnsID] = struct{}{}
+		var buf bytes.Buffer
+		vfsObj.GenerateProcMountInfo(ctx, realRoot, &buf)
+		mounts := MountsInfo{
+			MountNamespace: mntnsID,
+			MountInfo:      strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"),
+		}
+		if err := enc.Encode(FDsDumpRecord{Mounts: &mounts}); err != nil {
+			return err
+		}
+	}
+	if err := enc.Encode(FDsDumpRecord{Task: &info}); err != nil {
+		return err
+	}
+	if shared {
+		return nil
+	}
+
+	for _, no := range fdTable.GetFDs(ctx) {
+		fd, flags := fdTable.GetVFS2(no)
+		if fd == nil {
+			// The FD was closed since GetFDs returned.
+			continue
+		}
+		details := describeFD(ctx, t, vfsObj, realRoot, fd, no, tid)
+		details.CloseOnExec = flags.CloseOnExec
+		fd.DecRef(ctx)
+		if err := enc.Encode(FDsDumpRecord{FD: &details}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func describeFD(ctx context.Context, t *kernel.Task, vfsObj *vfs.VirtualFilesystem, realRoot vfs.VirtualDentry, fd *vfs.FileDescription, no, tid int32) FDDetails {
+	details := FDDetails{
+		TID:        tid,
+		Number:     no,
+		Type:       "anon",
+		Path:       pathname(ctx, vfsObj, realRoot, fd.VirtualDentry(), tid),
+		Filesystem: fd.Mount().Filesystem().FilesystemType().Name(),
+		Flags:      fd.StatusFlags(),
+		// Don't count the reference held by GetVFS2.
+		Refs: fd.ReadRefs() - 1,
+	}
+	if statx, err := fd.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_TYPE | linux.STATX_INO}); err != nil {
+		log.Warningf("Stat failed for fd %d in TID %d: %v", no, tid, err)
+	} else {
+		details.Type = fileType(statx.Mode)
+		details.Inode = statx.Ino
+	}
+	if details.Type == "regular" || details.Type == "directory" || details.Type == "block" {
+		if off, err := fd.Seek(ctx, 0, linux.SEEK_CUR); err == nil {
+			details.Offset = &off
+		}
+	}
+	if s, ok := fd.Impl().(socket.SocketVFS2); ok {
+		family, skType, protocol := s.Type()
+		sd := SocketDetails{
+			Family:   family,
+			Type:     int(skType),
+			Protocol: protocol,
+			State:    s.State(),
+		}
+		if addr, _, err := s.GetSockName(t); err == nil {
+			sd.Local = formatSockAddr(addr)
+		}
+		if addr, _, err := s.GetPeerName(t); err == nil {
+			sd.Peer = formatSockAddr(addr)
+		}
+		details.Socket = &sd
+	}
+	return details
+}
+
+func pathname(ctx context.Context, vfsObj *vfs.VirtualFilesystem, root, vd vfs.VirtualDentry, tid int32) string {
+	path, err := vfsObj.PathnameWithDeleted(ctx, root, vd)
+	if err != nil {
+		log.Warningf("PathnameWithDeleted failed in TID %d: %v", tid, err)
+		return ""
+	}
+	return path
+}
+
+func fileType(mode uint16) string {
+	switch mode & linux.S_IFMT {
+	case linux.S_IFREG:
+		return "regular"
+	case linux.S_IFDIR:
+		return "directory"
+	case linux.S_IFLNK:
+		return "symlink"
+	case linux.S_IFCHR:
+		return "char"
+	case linux.S_IFBLK:
+		return "block"
+	case linux.S_IFIFO:
+		return "fifo"
+	case linux.S_IFSOCK:
+		return "socket"
+	default:
+		return "anon"
+	}
+}
+
+// formatSockAddr returns a human-readable representation of addr.
+func formatSockAddr(addr linux.SockAddr) string {
+	switch a := addr.(type) {
+	case *linux.SockAddrInet:
+		return fmt.Sprintf("%d.%d.%d.%d:%d", a.Addr[0], a.Addr[1], a.Addr[2], a.Addr[3], socket.Ntohs(a.Port))
+	case *linux.SockAddrInet6:
+		return fmt.Sprintf("[%s]:%d", net.IP(a.Addr[:]), socket.Ntohs(a.Port))
+	case *linux.SockAddrUnix:
+		var b strings.Builder
+		for i, c := range a.Path {
+			if c == 0 {
+				if i == 0 {
+					// Abstract socket; the name follows the NUL byte.
+					b.WriteByte('@')
+					continue
+				}
+				break
+			}
+			b.WriteByte(byte(c))
+		}
+		return b.String()
+	case *linux.SockAddrNetlink:
+		return fmt.Sprintf("netlink:%d", a.PortID)
+	default:
+		return fmt.Sprintf("%T", addr)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -36,6 +37,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/cgroupfs"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devpts"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devtmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/ext"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/fuse"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/gofer"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/mqfs"
@@ -47,6 +49,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/specutils"
 )
@@ -57,6 +60,19 @@ const (
 	nonefs = "none"
 )
 
+// overlayUpperUniqueID is the gofer.InternalFilesystemOptions.UniqueID of the
+// upper layer of the root overlay when it is backed by a host directory. It
+// can't collide with mount destinations, which are absolute paths.
+const overlayUpperUniqueID = "overlay-upper:/"
+
+// CoreDumpMountPath is the path in each container at which the host directory
+// given by --core-dump-dir is mounted.
+const CoreDumpMountPath = "/run/gvisor/core"
+
+// CoreDumpPattern is the initial core_pattern of the sandbox when core dumps
+// are enabled, under CoreDumpMountPath.
+const CoreDumpPattern = CoreDumpMountPath + "/core.%e.%p"
+
 // tmpfs has some extra supported options that we must pass through.
 var tmpfsAllowedData = []string{"mode", "size", "uid", "gid"}
 
@@ -79,10 +95,17 @@ func registerFilesystems(k *kernel.Kernel) error {
 		AllowUserMount: true,
 		AllowUserList:  true,
 	})
+	vfsObj.MustRegisterFilesystemType(ext.Name, &ext.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserList: true,
+	})
 	vfsObj.MustRegisterFilesystemType(fuse.Name, &fuse.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserMount: true,
 		AllowUserList:  true,
 	})
+	vfsObj.MustRegisterFilesystemType(fuse.ControlName, &fuse.ControlFilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserMount: true,
+		AllowUserList:  true,
+	})
 	vfsObj.MustRegisterFilesystemType(gofer.Name, &gofer.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserList: true,
 	})
@@ -223,6 +246,15 @@ func compileMounts(spec *specs.Spec, conf *config.Config) []specs.Mount {
 		})
 	}
 
+	if conf.FUSE {
+		// Like cgroupfs, the mountpoint is created by sysfs. Mounts are
+		// sorted by destination, so this comes after /sys.
+		mandatoryMounts = append(mandatoryMounts, specs.Mount{
+			Type:        fuse.ControlName,
+			Destination: "/sys/fs/fuse/connections",
+		})
+	}
+
 	if !procMounted {
 		mandatoryMounts = append(mandatoryMounts, specs.Mount{
 			Type:        proc.Name,
@@ -271,6 +303,77 @@ func goferMountData(fd int, fa config.FileAccessType, lisafs bool) []string {
 	return opts
 }
 
+// goferIDMappings returns the ID mappings of an idmapped gofer mount at dest,
+// given its mappings from the spec. The gofer sees files owned by host IDs
+// translated by the mappings of its user namespace, userNS, if any, so the
+// host IDs of the mount's mappings are translated in the same way. Host IDs
+// that aren't mapped in userNS can't be told apart by the gofer, so files
+// they own are presented as owned by the overflow ID.
+func goferIDMappings(dest string, mappings, userNS []specs.LinuxIDMapping) []auth.IDMapEntry {
+	var entries []auth.IDMapEntry
+	for _, m := range mappings {
+		if len(userNS) == 0 {
+			entries = append(entries, auth.IDMapEntry{FirstID: m.ContainerID, FirstParentID: m.HostID, Length: m.Size})
+			continue
+		}
+		var mapped uint32
+		for _, ns := range userNS {
+			// Find the intersection of the host ID ranges, avoiding overflow.
+			start, end := uint64(m.HostID), uint64(m.HostID)+uint64(m.Size)
+			if nsStart := uint64(ns.HostID); nsStart > start {
+				start = nsStart
+			}
+			if nsEnd := uint64(ns.HostID) + uint64(ns.Size); nsEnd < end {
+				end = nsEnd
+			}
+			if start >= end {
+				continue
+			}
+			entries = append(entries, auth.IDMapEntry{
+				FirstID:       m.ContainerID + uint32(start-uint64(m.HostID)),
+				FirstParentID: ns.ContainerID + uint32(start-uint64(ns.HostID)),
+				Length:        uint32(end - start),
+			})
+			mapped += uint32(end - start)
+		}
+		if mapped != m.Size {
+			log.Warningf("Mount %q: %d of the %d host IDs starting at %d aren't mapped in the container's user namespace, files they own appear as owned by the overflow ID", dest, m.Size-mapped, m.Size, m.HostID)
+		}
+	}
+	return entries
+}
+
+// goferWritebackMountData returns the gofer mount data that enables
+// write-back caching if conf requests it. Mounts with shared file access
+// always use their default caching policy, since dirty data held in the
+// sandbox wouldn't be visible to other users of the files.
+func goferWritebackMountData(conf *config.Config, fa config.FileAccessType) []string {
+	if !conf.GoferWriteback || fa == config.FileAccessShared {
+		return nil
+	}
+	opts := []string{"cache=fscache_writeback"}
+	if conf.GoferDirtyBytes != 0 {
+		opts = append(opts, "dirty_bytes="+strconv.FormatUint(conf.GoferDirtyBytes, 10))
+	}
+	if conf.GoferDirtyExpire != 0 {
+		opts = append(opts, "dirty_expire="+conf.GoferDirtyExpire.String())
+	}
+	return opts
+}
+
+// goferReadaheadMountData returns the gofer mount data that sets the
+// readahead limit requested by conf, if any.
+func goferReadaheadMountData(conf *config.Config) []string {
+	switch {
+	case conf.GoferReadaheadBytes == 0:
+		return nil
+	case conf.GoferReadaheadBytes < 0:
+		return []string{"readahead_bytes=0"}
+	default:
+		return []string{"readahead_bytes=" + strconv.Itoa(conf.GoferReadaheadBytes)}
+	}
+}
+
 // parseAndFilterOptions parses a MountOptions slice and filters by the allowed
 // keys.
 func parseAndFilterOptions(opts []string, allowedKeys ...string) ([]string, error) {
@@ -313,6 +416,13 @@ func (f *fdDispenser) empty() bool {
 }
 
 type containerMounter struct {
+	// cid is the ID of the container.
+	cid string
+
+	// goferReconnectTimeout is the config.Config.GoferReconnectTimeout of the
+	// container.
+	goferReconnectTimeout time.Duration
+
 	root *specs.Root
 
 	// mounts is the set of submounts for the container. It's a copy from the spec
@@ -329,17 +439,40 @@ type containerMounter struct {
 	// productName is the value to show in
 	// /sys/devices/virtual/dmi/id/product_name.
 	productName string
+
+	// resources are the resource limits of the container from the spec, shown
+	// in /sys/fs/cgroup. It may be nil.
+	resources *specs.LinuxResources
+
+	// resolvConf, if not empty, is mounted over /etc/resolv.conf in the
+	// container.
+	resolvConf string
+
+	// userNSUIDMappings and userNSGIDMappings are the ID mappings of the
+	// user namespace that the container's gofer runs in, if any.
+	userNSUIDMappings []specs.LinuxIDMapping
+	userNSGIDMappings []specs.LinuxIDMapping
 }
 
 func newContainerMounter(info *containerInfo, k *kernel.Kernel, hints *podMountHints, productName string) *containerMounter {
-	return &containerMounter{
+	c := &containerMounter{
 		root:        info.spec.Root,
 		mounts:      compileMounts(info.spec, info.conf),
 		fds:         fdDispenser{fds: info.goferFDs},
 		k:           k,
 		hints:       hints,
 		productName: productName,
+
+		goferReconnectTimeout: info.conf.GoferReconnectTimeout,
 	}
+	if info.spec.Linux != nil {
+		c.resources = info.spec.Linux.Resources
+		if len(specutils.FilterNS([]specs.LinuxNamespaceType{specs.UserNamespace}, info.spec)) != 0 {
+			c.userNSUIDMappings = info.spec.Linux.UIDMappings
+			c.userNSGIDMappings = info.spec.Linux.GIDMappings
+		}
+	}
+	return c
 }
 
 func (c *containerMounter) checkDispenser() error {
@@ -403,14 +536,25 @@ func (c *containerMounter) mountAll(conf *config.Config, procArgs *kernel.Create
 func (c *containerMounter) createMountNamespace(ctx context.Context, conf *config.Config, creds *auth.Credentials) (*vfs.MountNamespace, error) {
 	fd := c.fds.remove()
 	data := goferMountData(fd, conf.FileAccess, conf.Lisafs)
+	data = append(data, goferWritebackMountData(conf, conf.FileAccess)...)
+	data = append(data, goferReadaheadMountData(conf)...)
 
 	// We can't check for overlayfs here because sandbox is chroot'ed and gofer
 	// can only send mount options for specs.Mounts (specs.Root is missing
 	// Options field). So assume root is always on top of overlayfs.
 	data = append(data, "overlayfs_stale_read")
 
-	// Configure the gofer dentry cache size.
+	// The gofer only donates host FDs for read-only connections, which it
+	// also uses for the lower layer of an overlay.
+	overlay2 := conf.GetOverlay2()
+	if conf.DirectFS && conf.Lisafs && (c.root.Readonly || overlay2.RootMount) {
+		data = append(data, "directfs")
+	}
+
+	// Configure the gofer dentry and page cache sizes.
 	gofer.SetDentryCacheSize(conf.DCache)
+	gofer.SetMaxCachedDentriesPerMount(conf.MaxDentriesPerMount)
+	gofer.SetMaxCachedFileBytes(conf.MaxCachedFileBytes)
 
 	log.Infof("Mounting root with gofer, ioFD: %d", fd)
 	opts := &vfs.MountOptions{
@@ -418,18 +562,28 @@ func (c *containerMounter) createMountNamespace(ctx context.Context, conf *confi
 		GetFilesystemOptions: vfs.GetFilesystemOptions{
 			Data: strings.Join(data, ","),
 			InternalData: gofer.InternalFilesystemOptions{
-				UniqueID: "/",
+				UniqueID:         "/",
+				ReconnectTimeout: c.goferReconnectTimeout,
+				ContainerID:      c.cid,
 			},
 		},
 		InternalMount: true,
 	}
 
 	fsName := gofer.Name
-	if conf.Overlay && !c.root.Readonly {
-		log.Infof("Adding overlay on top of root")
+	if overlay2.RootMount && !c.root.Readonly {
+		// If the upper layer is backed by a host directory, the gofer serves
+		// it on the connection following the root's.
+		upperFD := -1
+		if overlay2.IsBackedByHostDir() {
+			upperFD = c.fds.remove()
+			log.Infof("Adding overlay on top of root, upper layer ioFD: %d", upperFD)
+		} else {
+			log.Infof("Adding overlay on top of root")
+		}
 		var err error
 		var cleanup func()
-		opts, cleanup, err = c.configureOverlay(ctx, creds, opts, fsName)
+		opts, cleanup, err = c.configureOverlay(ctx, creds, opts, fsName, upperFD)
 		if err != nil {
 			return nil, fmt.Errorf("mounting root with overlay: %w", err)
 		}
@@ -445,10 +599,11 @@ func (c *containerMounter) createMountNamespace(ctx context.Context, conf *confi
 }
 
 // configureOverlay mounts the lower layer using "lowerOpts", mounts the upper
-// layer using tmpfs, and return overlay mount options. "cleanup" must be called
-// after the options have been used to mount the overlay, to release refs on
-// lower and upper mounts.
-func (c *containerMounter) configureOverlay(ctx context.Context, creds *auth.Credentials, lowerOpts *vfs.MountOptions, lowerFSName string) (*vfs.MountOptions, func(), error) {
+// layer using tmpfs, or using the gofer connection "upperFD" if it isn't -1,
+// and return overlay mount options. "cleanup" must be called after the options
+// have been used to mount the overlay, to release refs on lower and upper
+// mounts.
+func (c *containerMounter) configureOverlay(ctx context.Context, creds *auth.Credentials, lowerOpts *vfs.MountOptions, lowerFSName string, upperFD int) (*vfs.MountOptions, func(), error) {
 	// First copy options from lower layer to upper layer and overlay. Clear
 	// filesystem specific options.
 	upperOpts := *lowerOpts
@@ -485,11 +640,30 @@ func (c *containerMounter) configureOverlay(ctx context.Context, creds *auth.Cre
 		return nil, nil, fmt.Errorf("lower layer's root has unsupported file type %v", rootType)
 	}
 
-	// Upper is a tmpfs mount to keep all modifications inside the sandbox.
-	upperOpts.GetFilesystemOptions.InternalData = tmpfs.FilesystemOpts{
-		RootFileType: uint16(rootType),
+	var upper *vfs.Mount
+	if upperFD >= 0 {
+		// Upper is a gofer mount of a host directory, so that modifications
+		// persist across sandbox restarts. Whiteouts and overlay extended
+		// attributes are stored on the host as with Linux overlayfs.
+		if rootType != linux.S_IFDIR {
+			return nil, nil, fmt.Errorf("lower layer's root must be a directory for a host directory upper layer, got file type %v", rootType)
+		}
+		upperOpts.GetFilesystemOptions = vfs.GetFilesystemOptions{
+			Data: strings.Join(goferMountData(upperFD, config.FileAccessExclusive, true /* lisafs */), ","),
+			InternalData: gofer.InternalFilesystemOptions{
+				UniqueID:         overlayUpperUniqueID,
+				ReconnectTimeout: c.goferReconnectTimeout,
+				ContainerID:      c.cid,
+			},
+		}
+		upper, err = c.k.VFS().MountDisconnected(ctx, creds, "" /* source */, gofer.Name, &upperOpts)
+	} else {
+		// Upper is a tmpfs mount to keep all modifications inside the sandbox.
+		upperOpts.GetFilesystemOptions.InternalData = tmpfs.FilesystemOpts{
+			RootFileType: uint16(rootType),
+		}
+		upper, err = c.k.VFS().MountDisconnected(ctx, creds, "" /* source */, tmpfs.Name, &upperOpts)
 	}
-	upper, err := c.k.VFS().MountDisconnected(ctx, creds, "" /* source */, tmpfs.Name, &upperOpts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create upper layer for overlay, opts: %+v: %v", upperOpts, err)
 	}
@@ -593,6 +767,11 @@ func (c *containerMounter) mountSubmounts(ctx context.Context, conf *config.Conf
 	if err := c.mountTmp(ctx, conf, creds, mns); err != nil {
 		return fmt.Errorf(`mount submount "\tmp": %w`, err)
 	}
+	if c.resolvConf != "" {
+		if err := c.mountResolvConf(ctx, creds, mns); err != nil {
+			return fmt.Errorf("mount %q: %w", resolvConfPath, err)
+		}
+	}
 	return nil
 }
 
@@ -610,10 +789,10 @@ func (c *containerMounter) prepareMounts() ([]mountAndFD, error) {
 		m := &c.mounts[i]
 		specutils.MaybeConvertToBindMount(m)
 
-		// Only bind mounts use host FDs; see
+		// Only bind mounts and ext image mounts use host FDs; see
 		// containerMounter.getMountNameAndOptions.
 		fd := -1
-		if m.Type == bind {
+		if m.Type == bind || specutils.IsExtImageMount(*m) {
 			fd = c.fds.remove()
 		}
 		mounts = append(mounts, mountAndFD{
@@ -650,7 +829,7 @@ func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Confi
 	if useOverlay {
 		log.Infof("Adding overlay on top of mount %q", submount.mount.Destination)
 		var cleanup func()
-		opts, cleanup, err = c.configureOverlay(ctx, creds, opts, fsName)
+		opts, cleanup, err = c.configureOverlay(ctx, creds, opts, fsName, -1 /* upperFD */)
 		if err != nil {
 			return nil, fmt.Errorf("mounting volume with overlay at %q: %w", submount.mount.Destination, err)
 		}
@@ -674,6 +853,27 @@ func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Confi
 	return mnt, nil
 }
 
+// sysCgroupLimits returns the resource limits to show in the read-only
+// cgroup view in sysfs.
+func sysCgroupLimits(resources *specs.LinuxResources) *sys.CgroupLimits {
+	limits := &sys.CgroupLimits{}
+	if resources == nil {
+		return limits
+	}
+	if cpu := resources.CPU; cpu != nil {
+		if cpu.Quota != nil {
+			limits.CPUQuota = *cpu.Quota
+		}
+		if cpu.Period != nil {
+			limits.CPUPeriod = *cpu.Period
+		}
+	}
+	if mem := resources.Memory; mem != nil && mem.Limit != nil {
+		limits.MemoryLimit = *mem.Limit
+	}
+	return limits
+}
+
 // getMountNameAndOptions retrieves the fsName, opts, and useOverlay values
 // used for mounts.
 func (c *containerMounter) getMountNameAndOptions(conf *config.Config, m *mountAndFD) (string, *vfs.MountOptions, bool, error) {
@@ -682,19 +882,21 @@ func (c *containerMounter) getMountNameAndOptions(conf *config.Config, m *mountA
 	var (
 		data         []string
 		internalData interface{}
+		readOnly     bool
 	)
 
 	// Find filesystem name and FS specific data field.
 	switch m.mount.Type {
-	case devpts.Name, devtmpfs.Name, proc.Name:
+	case devpts.Name, devtmpfs.Name, fuse.ControlName, proc.Name:
 		// Nothing to do.
 
 	case nonefs:
 		fsName = sys.Name
 
 	case sys.Name:
-		if len(c.productName) > 0 {
-			internalData = &sys.InternalData{ProductName: c.productName}
+		internalData = &sys.InternalData{
+			ProductName: c.productName,
+			Cgroup:      sysCgroupLimits(c.resources),
 		}
 
 	case tmpfs.Name:
@@ -711,13 +913,61 @@ func (c *containerMounter) getMountNameAndOptions(conf *config.Config, m *mountA
 			// but unlikely to be correct in this context.
 			return "", nil, false, fmt.Errorf("gofer mount requires a connection FD")
 		}
-		data = goferMountData(m.fd, c.getMountAccessType(conf, m.mount), conf.Lisafs)
+		fa := c.getMountAccessType(conf, m.mount)
+		hostProcSys := conf.HostProcSysMounts && specutils.IsHostProcSysMount(*m.mount)
+		if hostProcSys {
+			// Files in host /proc and /sys change underneath the sandbox and
+			// report a size of 0, so they can't be cached.
+			fa = config.FileAccessShared
+		}
+		data = goferMountData(m.fd, fa, conf.Lisafs)
+		data = append(data, goferWritebackMountData(conf, fa)...)
+		data = append(data, goferReadaheadMountData(conf)...)
+		uids, gids, err := specutils.MountIDMappings(m.mount)
+		if err != nil {
+			return "", nil, false, err
+		}
 		internalData = gofer.InternalFilesystemOptions{
-			UniqueID: m.mount.Destination,
+			UniqueID:         m.mount.Destination,
+			UIDMappings:      goferIDMappings(m.mount.Destination, uids, c.userNSUIDMappings),
+			GIDMappings:      goferIDMappings(m.mount.Destination, gids, c.userNSGIDMappings),
+			ReconnectTimeout: c.goferReconnectTimeout,
+			ContainerID:      c.cid,
+		}
+
+		if hostProcSys {
+			// Host /proc and /sys are only ever passed through read-only, and
+			// aren't backed by an overlay.
+			readOnly = true
+			break
+		}
+		if hint := c.hints.findMount(m.mount); hint != nil && hint.hostSHM {
+			// Memory mappings must map the host files directly, so the mount
+			// can't be backed by an overlay either.
+			data = append(data, "host_shm")
+			break
+		}
+		if hint := c.hints.findMount(m.mount); hint != nil && hint.verity != "" {
+			// Verity mounts are immutable, so they are read-only and aren't
+			// backed by an overlay.
+			data = append(data, "verity="+hint.verity)
+			readOnly = true
+			break
 		}
 
 		// If configured, add overlay to all writable mounts.
-		useOverlay = conf.Overlay && !parseMountOptions(m.mount.Options).ReadOnly
+		useOverlay = conf.GetOverlay2().SubMounts && !parseMountOptions(m.mount.Options).ReadOnly
+
+	case ext.Name:
+		if m.fd < 0 {
+			return "", nil, false, fmt.Errorf("ext4 mount requires an image path")
+		}
+		internalData = &ext.InternalData{
+			HostFD:   m.fd,
+			UniqueID: m.mount.Destination,
+		}
+		// The image is never written to.
+		readOnly = true
 
 	case cgroupfs.Name:
 		var err error
@@ -732,6 +982,9 @@ func (c *containerMounter) getMountNameAndOptions(conf *config.Config, m *mountA
 	}
 
 	opts := parseMountOptions(m.mount.Options)
+	if readOnly {
+		opts.ReadOnly = true
+	}
 	opts.GetFilesystemOptions = vfs.GetFilesystemOptions{
 		Data:         strings.Join(data, ","),
 		InternalData: internalData,
@@ -758,6 +1011,10 @@ func parseMountOptions(opts []string) *vfs.MountOptions {
 		case "bind", "rbind":
 			// These are the same as a mount with type="bind".
 		default:
+			if specutils.IsIDMappingOption(o) {
+				// Handled by the gofer filesystem; see goferIDMappings.
+				continue
+			}
 			log.Warningf("ignoring unknown mount option %q", o)
 		}
 	}
@@ -846,6 +1103,57 @@ func (c *containerMounter) mountTmp(ctx context.Context, conf *config.Config, cr
 	}
 }
 
+// resolvConfPath is the path of resolv.conf(5) inside containers.
+const resolvConfPath = "/etc/resolv.conf"
+
+// mountResolvConf mounts a tmpfs file containing c.resolvConf over
+// /etc/resolv.conf, so that the container uses the DNS servers leased with
+// DHCP without its root filesystem being modified. The file isn't mounted if
+// /etc/resolv.conf doesn't exist or isn't a regular file.
+func (c *containerMounter) mountResolvConf(ctx context.Context, creds *auth.Credentials, mns *vfs.MountNamespace) error {
+	root := mns.Root()
+	root.IncRef()
+	defer root.DecRef(ctx)
+	pop := vfs.PathOperation{
+		Root:               root,
+		Start:              root,
+		Path:               fspath.Parse(resolvConfPath),
+		FollowFinalSymlink: true,
+	}
+	stat, err := c.k.VFS().StatAt(ctx, creds, &pop, &vfs.StatOptions{Mask: linux.STATX_TYPE})
+	switch {
+	case linuxerr.Equals(linuxerr.ENOENT, err):
+		log.Infof("Skipping DHCP resolv.conf because %q doesn't exist", resolvConfPath)
+		return nil
+	case err != nil:
+		return err
+	case stat.Mode&linux.S_IFMT != linux.S_IFREG:
+		log.Infof("Skipping DHCP resolv.conf because %q isn't a regular file", resolvConfPath)
+		return nil
+	}
+
+	opts := &vfs.MountOptions{
+		GetFilesystemOptions: vfs.GetFilesystemOptions{
+			Data:         "mode=0644",
+			InternalData: tmpfs.FilesystemOpts{RootFileType: linux.S_IFREG},
+		},
+		InternalMount: true,
+	}
+	if _, err := c.k.VFS().MountAt(ctx, creds, "" /* source */, &pop, tmpfs.Name, opts); err != nil {
+		return err
+	}
+	fd, err := c.k.VFS().OpenAt(ctx, creds, &pop, &vfs.OpenOptions{Flags: linux.O_WRONLY})
+	if err != nil {
+		return err
+	}
+	defer fd.DecRef(ctx)
+	if _, err := fd.Write(ctx, usermem.BytesIOSequence([]byte(c.resolvConf)), vfs.WriteOptions{}); err != nil {
+		return err
+	}
+	log.Infof("Mounted DHCP resolv.conf over %q", resolvConfPath)
+	return nil
+}
+
 // processHints processes annotations that container hints about how volumes
 // should be mounted (e.g. a volume shared between containers). It must be
 // called for the root container only.
@@ -885,7 +1193,7 @@ func (c *containerMounter) mountSharedMaster(ctx context.Context, conf *config.C
 	if useOverlay {
 		log.Infof("Adding overlay on top of shared mount %q", mntFD.mount.Destination)
 		var cleanup func()
-		opts, cleanup, err = c.configureOverlay(ctx, creds, opts, fsName)
+		opts, cleanup, err = c.configureOverlay(ctx, creds, opts, fsName, -1 /* upperFD */)
 		if err != nil {
 			return nil, fmt.Errorf("mounting shared volume with overlay at %q: %w", mntFD.mount.Destination, err)
 		}
@@ -955,18 +1263,40 @@ func (c *containerMounter) makeMountPoint(ctx context.Context, creds *auth.Crede
 
 // configureRestore returns an updated context.Context including filesystem
 // state used by restore defined by conf.
-func (c *containerMounter) configureRestore(ctx context.Context) (context.Context, error) {
+func (c *containerMounter) configureRestore(ctx context.Context, conf *config.Config) (context.Context, error) {
+	fdmap, extFDMap, err := c.serverFDMaps(conf)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, ext.CtxRestoreFDMap, extFDMap)
+	return context.WithValue(ctx, gofer.CtxRestoreServerFDMap, fdmap), nil
+}
+
+// serverFDMaps dispenses the container's FDs to the filesystems that use
+// them. It returns maps from gofer filesystem unique IDs (cf.
+// gofer.InternalFilesystemOptions.UniqueID) and ext mount destinations to
+// host FDs.
+func (c *containerMounter) serverFDMaps(conf *config.Config) (map[string]int, map[string]int, error) {
 	fdmap := make(map[string]int)
 	fdmap["/"] = c.fds.remove()
+	if overlay2 := conf.GetOverlay2(); overlay2.IsBackedByHostDir() && !c.root.Readonly {
+		fdmap[overlayUpperUniqueID] = c.fds.remove()
+	}
 	mounts, err := c.prepareMounts()
 	if err != nil {
-		return ctx, err
+		return nil, nil, err
 	}
+	extFDMap := make(map[string]int)
 	for i := range c.mounts {
 		submount := &mounts[i]
-		if submount.fd >= 0 {
+		if submount.fd < 0 {
+			continue
+		}
+		if submount.mount.Type == ext.Name {
+			extFDMap[submount.mount.Destination] = submount.fd
+		} else {
 			fdmap[submount.mount.Destination] = submount.fd
 		}
 	}
-	return context.WithValue(ctx, gofer.CtxRestoreServerFDMap, fdmap), nil
+	return fdmap, extFDMap, nil
 }
@@ -15,9 +15,12 @@
 package boot
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/runsc/config"
 )
 
@@ -79,3 +82,106 @@ func TestGetMountAccessType(t *testing.T) {
 		})
 	}
 }
+
+func TestGoferWritebackMountData(t *testing.T) {
+	for _, tst := range []struct {
+		name string
+		conf config.Config
+		fa   config.FileAccessType
+		want []string
+	}{
+		{
+			name: "disabled",
+			conf: config.Config{},
+			fa:   config.FileAccessExclusive,
+		},
+		{
+			name: "exclusive",
+			conf: config.Config{GoferWriteback: true},
+			fa:   config.FileAccessExclusive,
+			want: []string{"cache=fscache_writeback"},
+		},
+		{
+			name: "shared",
+			conf: config.Config{GoferWriteback: true},
+			fa:   config.FileAccessShared,
+		},
+		{
+			name: "limits",
+			conf: config.Config{
+				GoferWriteback:   true,
+				GoferDirtyBytes:  1 << 20,
+				GoferDirtyExpire: 5 * time.Second,
+			},
+			fa:   config.FileAccessExclusive,
+			want: []string{"cache=fscache_writeback", "dirty_bytes=1048576", "dirty_expire=5s"},
+		},
+	} {
+		t.Run(tst.name, func(t *testing.T) {
+			if got := goferWritebackMountData(&tst.conf, tst.fa); !reflect.DeepEqual(got, tst.want) {
+				t.Errorf("goferWritebackMountData(), want: %v, got: %v", tst.want, got)
+			}
+		})
+	}
+}
+
+func TestGoferReadaheadMountData(t *testing.T) {
+	for _, tst := range []struct {
+		bytes int
+		want  []string
+	}{
+		{bytes: 0},
+		{bytes: -1, want: []string{"readahead_bytes=0"}},
+		{bytes: 1 << 20, want: []string{"readahead_bytes=1048576"}},
+	} {
+		conf := config.Config{GoferReadaheadBytes: tst.bytes}
+		if got := goferReadaheadMountData(&conf); !reflect.DeepEqual(got, tst.want) {
+			t.Errorf("goferReadaheadMountData(GoferReadaheadBytes: %d), want: %v, got: %v", tst.bytes, tst.want, got)
+		}
+	}
+}
+
+func TestGoferIDMappings(t *testing.T) {
+	for _, tst := range []struct {
+		name     string
+		mappings []specs.LinuxIDMapping
+		userNS   []specs.LinuxIDMapping
+		want     []auth.IDMapEntry
+	}{
+		{
+			name:     "no userns",
+			mappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}},
+			want:     []auth.IDMapEntry{{FirstID: 0, FirstParentID: 100000, Length: 65536}},
+		},
+		{
+			name:     "userns",
+			mappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 1000}},
+			userNS:   []specs.LinuxIDMapping{{ContainerID: 0, HostID: 99000, Size: 65536}},
+			want:     []auth.IDMapEntry{{FirstID: 0, FirstParentID: 1000, Length: 1000}},
+		},
+		{
+			name:     "split",
+			mappings: []specs.LinuxIDMapping{{ContainerID: 10, HostID: 1000, Size: 100}},
+			userNS: []specs.LinuxIDMapping{
+				{ContainerID: 0, HostID: 1050, Size: 10},
+				{ContainerID: 500, HostID: 900, Size: 120},
+				{ContainerID: 2000, HostID: 5000, Size: 10},
+			},
+			want: []auth.IDMapEntry{
+				{FirstID: 60, FirstParentID: 0, Length: 10},
+				{FirstID: 10, FirstParentID: 600, Length: 20},
+			},
+		},
+		{
+			name:     "unmapped",
+			mappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 1000, Size: 10}},
+			userNS:   []specs.LinuxIDMapping{{ContainerID: 0, HostID: 0, Size: 1000}},
+		},
+	} {
+		t.Run(tst.name, func(t *testing.T) {
+			if got := goferIDMappings("/dest", tst.mappings, tst.userNS); !reflect.DeepEqual(got, tst.want) {
+				t.Errorf("goferIDMappings(), want: %v, got: %v", tst.want, got)
+			}
+		})
+	}
+}
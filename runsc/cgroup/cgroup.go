@@ -24,8 +24,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -47,6 +49,9 @@ const (
 
 	// cgroupRoot is the cgroupfs root this module uses.
 	cgroupRoot = "/sys/fs/cgroup"
+
+	// userHZ is the frequency of the clock ticks used by cpuacct.stat.
+	userHZ = 100
 )
 
 var controllers = map[string]controller{
@@ -79,6 +84,60 @@ func IsOnlyV2() bool {
 	return stat.Type == unix.CGROUP2_SUPER_MAGIC
 }
 
+// CheckControllers verifies that the cgroup controllers required to apply res
+// are available on the host, without creating any cgroup. It returns the
+// sorted names of optional controllers that are missing and would be skipped
+// by Install.
+func CheckControllers(res *specs.LinuxResources) ([]string, error) {
+	var skipped []string
+	if IsOnlyV2() {
+		data, err := ioutil.ReadFile(filepath.Join(cgroupRoot, controllersFile))
+		if err != nil {
+			return nil, err
+		}
+		available := strings.Fields(string(data))
+		for name, ctrlr := range controllers2 {
+			found := false
+			for _, a := range available {
+				if a == name {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+			if !ctrlr.optional() {
+				return nil, fmt.Errorf("mandatory cgroup controller %q is missing in %q", name, cgroupRoot)
+			}
+			if err := ctrlr.skip(res); err != nil {
+				return nil, err
+			}
+			skipped = append(skipped, name)
+		}
+	} else {
+		if res != nil && len(res.Unified) > 0 {
+			return nil, fmt.Errorf("%w: unified resources are only supported with cgroup v2", ErrBadResourceSpec)
+		}
+		for name, ctrlr := range controllers {
+			if _, ok := ctrlr.(*noop); ok {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(cgroupRoot, name)); err == nil {
+				continue
+			} else if !os.IsNotExist(err) || !ctrlr.optional() {
+				return nil, fmt.Errorf("cgroup controller %q is not available: %w", name, err)
+			}
+			if err := ctrlr.skip(res); err != nil {
+				return nil, err
+			}
+			skipped = append(skipped, name)
+		}
+	}
+	sort.Strings(skipped)
+	return skipped, nil
+}
+
 func setOptionalValueInt(path, name string, val *int64) error {
 	if val == nil || *val == 0 {
 		return nil
@@ -147,6 +206,52 @@ func getInt(path, name string) (int, error) {
 	return strconv.Atoi(strings.TrimSpace(s))
 }
 
+// readStatUint reads the number in the cgroup file 'name' into v. "max" is
+// read as math.MaxUint64. A missing file, e.g. because its controller isn't
+// enabled, leaves v unchanged.
+func readStatUint(path, name string, v *uint64) error {
+	s, err := getValue(path, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	s = strings.TrimSpace(s)
+	if s == "max" {
+		*v = math.MaxUint64
+		return nil
+	}
+	val, err := parseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing %q: %w", filepath.Join(path, name), err)
+	}
+	*v = val
+	return nil
+}
+
+// readStatKeyValues reads a cgroup file made of "key value" lines, like
+// memory.stat. It returns nil if the file doesn't exist.
+func readStatKeyValues(path, name string) (map[string]uint64, error) {
+	s, err := getValue(path, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	m := make(map[string]uint64)
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		key, value, err := parseKeyValue(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %w", filepath.Join(path, name), err)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
 // fillFromAncestor sets the value of a cgroup file from the first ancestor
 // that has content. It does nothing if the file in 'path' has already been set.
 func fillFromAncestor(path string) (string, error) {
@@ -323,9 +428,49 @@ type Cgroup interface {
 	CPUUsage() (uint64, error)
 	NumCPU() (int, error)
 	MemoryLimit() (uint64, error)
+	Stats() (*Stats, error)
 	MakePath(controllerName string) string
 }
 
+// Stats contains the resource usage statistics of a cgroup, as reported by
+// "runsc events". Statistics of controllers that aren't available are left
+// zero.
+type Stats struct {
+	// CPUUsage is the total CPU time consumed by the processes in the cgroup,
+	// and CPUUser and CPUKernel the time spent in user and kernel mode, in
+	// nanoseconds.
+	CPUUsage  uint64
+	CPUUser   uint64
+	CPUKernel uint64
+
+	// MemoryUsage is the current memory usage and MemoryMaxUsage the highest
+	// recorded memory usage, in bytes.
+	MemoryUsage    uint64
+	MemoryMaxUsage uint64
+
+	// MemoryLimit is the memory limit in bytes, math.MaxUint64 if unlimited.
+	MemoryLimit uint64
+
+	// MemoryFailcnt is the number of times the memory limit was hit.
+	MemoryFailcnt uint64
+
+	// MemoryCache is the page cache usage in bytes.
+	MemoryCache uint64
+
+	// SwapUsage and SwapLimit are the memory+swap usage and limit in bytes,
+	// like memory.memsw.* in cgroup v1.
+	SwapUsage uint64
+	SwapLimit uint64
+
+	// MemoryStat holds the raw counters from memory.stat.
+	MemoryStat map[string]uint64
+
+	// PidsCurrent is the number of processes in the cgroup, and PidsLimit the
+	// maximum number allowed, 0 if unlimited.
+	PidsCurrent uint64
+	PidsLimit   uint64
+}
+
 // cgroupV1 represents a group inside all controllers. For example:
 //
 //	Name='/foo/bar' maps to /sys/fs/cgroup/<controller>/foo/bar on
@@ -391,9 +536,15 @@ func new(pid, cgroupsPath string, useSystemd bool) (Cgroup, error) {
 		// The cgroupsPath is in a special `slice:prefix:name` format for systemd
 		// that should not be modified.
 		if p, ok := parents[cgroup2Key]; ok && !useSystemd {
-			// The cgroup of current pid will have tasks in it and we can't use
-			// that, instead, use the its parent which should not have tasks in it.
-			cgroupsPath = filepath.Join(filepath.Dir(p), cgroupsPath)
+			if cgroupsPath == "" {
+				// Loading the cgroup of a process, e.g. the sandbox.
+				cgroupsPath = p
+			} else {
+				// The cgroup of current pid will have tasks in it and we can't use
+				// that, instead, use the its parent which should not have tasks in
+				// it.
+				cgroupsPath = filepath.Join(filepath.Dir(p), cgroupsPath)
+			}
 		}
 		// Assume that for v2, cgroup is always mounted at cgroupRoot.
 		cg, err = newCgroupV2(cgroupRoot, cgroupsPath, useSystemd)
@@ -481,6 +632,9 @@ func (c *CgroupJSON) MarshalJSON() ([]byte, error) {
 // pre-configured cgroups, and 'res' is ignored.
 func (c *cgroupV1) Install(res *specs.LinuxResources) error {
 	log.Debugf("Installing cgroup path %q", c.Name)
+	if res != nil && len(res.Unified) > 0 {
+		return fmt.Errorf("%w: unified resources are only supported with cgroup v2", ErrBadResourceSpec)
+	}
 
 	// Clean up partially created cgroups on error. Errors during cleanup itself
 	// are ignored.
@@ -653,6 +807,53 @@ func (c *cgroupV1) CPUUsage() (uint64, error) {
 	return strconv.ParseUint(strings.TrimSpace(usage), 10, 64)
 }
 
+// Stats returns the resource usage statistics of the cgroup.
+func (c *cgroupV1) Stats() (*Stats, error) {
+	stats := &Stats{}
+
+	cpuacct := c.MakePath("cpuacct")
+	if err := readStatUint(cpuacct, "cpuacct.usage", &stats.CPUUsage); err != nil {
+		return nil, err
+	}
+	cpuStat, err := readStatKeyValues(cpuacct, "cpuacct.stat")
+	if err != nil {
+		return nil, err
+	}
+	// cpuacct.stat is in USER_HZ units.
+	stats.CPUUser = cpuStat["user"] * uint64(time.Second/userHZ)
+	stats.CPUKernel = cpuStat["system"] * uint64(time.Second/userHZ)
+
+	memory := c.MakePath("memory")
+	for name, v := range map[string]*uint64{
+		"memory.usage_in_bytes":       &stats.MemoryUsage,
+		"memory.max_usage_in_bytes":   &stats.MemoryMaxUsage,
+		"memory.limit_in_bytes":       &stats.MemoryLimit,
+		"memory.failcnt":              &stats.MemoryFailcnt,
+		"memory.memsw.usage_in_bytes": &stats.SwapUsage,
+		"memory.memsw.limit_in_bytes": &stats.SwapLimit,
+	} {
+		if err := readStatUint(memory, name, v); err != nil {
+			return nil, err
+		}
+	}
+	if stats.MemoryStat, err = readStatKeyValues(memory, "memory.stat"); err != nil {
+		return nil, err
+	}
+	stats.MemoryCache = stats.MemoryStat["cache"]
+
+	pids := c.MakePath("pids")
+	if err := readStatUint(pids, "pids.current", &stats.PidsCurrent); err != nil {
+		return nil, err
+	}
+	if err := readStatUint(pids, "pids.max", &stats.PidsLimit); err != nil {
+		return nil, err
+	}
+	if stats.PidsLimit == math.MaxUint64 {
+		stats.PidsLimit = 0
+	}
+	return stats, nil
+}
+
 // NumCPU returns the number of CPUs configured in 'cpuset/cpuset.cpus'.
 func (c *cgroupV1) NumCPU() (int, error) {
 	path := c.MakePath("cpuset")
@@ -44,6 +44,10 @@ const (
 	controllersFile = "cgroup.controllers"
 	cgroup2Key      = "cgroup2"
 
+	// leafCgroup is the name of the cgroup created for the sandbox processes
+	// when the sandbox cgroup has controllers enabled for its children.
+	leafCgroup = "sandbox"
+
 	// https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html
 	defaultPeriod = 100000
 )
@@ -162,6 +166,12 @@ func (c *cgroupV2) Install(res *specs.LinuxResources) error {
 				return fmt.Errorf("mandatory cgroup controller %q is missing for %q", controllerName, c.MakePath(""))
 			}
 		}
+		// Unified resources are applied last, so they take precedence.
+		if res != nil {
+			if err := setUnified(c.MakePath(""), res.Unified, c.Controllers); err != nil {
+				return err
+			}
+		}
 	}
 
 	clean.Release()
@@ -223,13 +233,71 @@ func (c *cgroupV2) Join() (func(), error) {
 	defer cu.Clean()
 
 	// now join the cgroup
-	if err := setValue(c.MakePath(""), "cgroup.procs", "0"); err != nil {
+	path, err := c.joinPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := setValue(path, "cgroup.procs", "0"); err != nil {
 		return nil, err
 	}
 
 	return cu.Release(), nil
 }
 
+// joinPath returns the path of the cgroup that processes should join. In
+// cgroup v2, processes can't be in a cgroup that has controllers enabled for
+// its children ("no internal processes" rule), which is the case of pod
+// cgroups that hold the cgroups of their containers. Processes are then placed
+// in a leafCgroup child, which is removed by Uninstall if it was created here.
+func (c *cgroupV2) joinPath() (string, error) {
+	path := c.MakePath("")
+	subtree, err := getValue(path, subtreeControl)
+	if err != nil {
+		return "", err
+	}
+	if len(strings.TrimSpace(subtree)) == 0 {
+		return path, nil
+	}
+	leaf := filepath.Join(path, leafCgroup)
+	if err := os.Mkdir(leaf, 0o755); err != nil {
+		if !os.IsExist(err) {
+			return "", err
+		}
+	} else {
+		c.Own = append(c.Own, leaf)
+	}
+	return leaf, nil
+}
+
+// setUnified writes the cgroup v2 files in unified, which maps file names to
+// values as in LinuxResources.Unified, to the cgroup at path.
+func setUnified(path string, unified map[string]string, controllers []string) error {
+	for name, value := range unified {
+		if strings.Contains(name, "/") {
+			return fmt.Errorf("%w: unified resource %q must be a file name", ErrBadResourceSpec, name)
+		}
+		if err := setValue(path, name, value); err != nil {
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("setting unified resource %q: %w", name, err)
+			}
+			// Files of missing controllers don't exist, return a more helpful
+			// error in this case.
+			ctrl := strings.SplitN(name, ".", 2)[0]
+			found := ctrl == "cgroup"
+			for _, c := range controllers {
+				if c == ctrl {
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("%w: unified resource %q requires the %q controller, which is not available", ErrBadResourceSpec, name, ctrl)
+			}
+			return fmt.Errorf("%w: unified resource %q: %v", ErrBadResourceSpec, name, err)
+		}
+	}
+	return nil
+}
+
 // CPUQuota returns the CFS CPU quota.
 func (c *cgroupV2) CPUQuota() (float64, error) {
 	cpuMax, err := getValue(c.MakePath(""), "cpu.max")
@@ -282,13 +350,65 @@ func (c *cgroupV2) CPUUsage() (uint64, error) {
 			return 0, err
 		}
 		if key == "usage_usec" {
-			return value, nil
+			// Report nanoseconds, like cpuacct.usage in cgroup v1.
+			return value * uint64(time.Microsecond), nil
 		}
 	}
 
 	return 0, nil
 }
 
+// Stats returns the resource usage statistics of the cgroup.
+func (c *cgroupV2) Stats() (*Stats, error) {
+	path := c.MakePath("")
+	stats := &Stats{}
+
+	// cpu.stat usage is always available, even without the cpu controller.
+	cpuStat, err := readStatKeyValues(path, "cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+	stats.CPUUsage = cpuStat["usage_usec"] * uint64(time.Microsecond)
+	stats.CPUUser = cpuStat["user_usec"] * uint64(time.Microsecond)
+	stats.CPUKernel = cpuStat["system_usec"] * uint64(time.Microsecond)
+
+	var swapUsage, swapLimit uint64
+	for name, v := range map[string]*uint64{
+		"memory.current":      &stats.MemoryUsage,
+		"memory.peak":         &stats.MemoryMaxUsage,
+		"memory.max":          &stats.MemoryLimit,
+		"memory.swap.current": &swapUsage,
+		"memory.swap.max":     &swapLimit,
+		"pids.current":        &stats.PidsCurrent,
+		"pids.max":            &stats.PidsLimit,
+	} {
+		if err := readStatUint(path, name, v); err != nil {
+			return nil, err
+		}
+	}
+	if stats.PidsLimit == math.MaxUint64 {
+		stats.PidsLimit = 0
+	}
+	// Swap is reported as memory+swap to match cgroup v1.
+	stats.SwapUsage = stats.MemoryUsage + swapUsage
+	if stats.MemoryLimit == math.MaxUint64 || swapLimit == math.MaxUint64 {
+		stats.SwapLimit = math.MaxUint64
+	} else {
+		stats.SwapLimit = stats.MemoryLimit + swapLimit
+	}
+
+	if stats.MemoryStat, err = readStatKeyValues(path, "memory.stat"); err != nil {
+		return nil, err
+	}
+	stats.MemoryCache = stats.MemoryStat["file"]
+	events, err := readStatKeyValues(path, "memory.events")
+	if err != nil {
+		return nil, err
+	}
+	stats.MemoryFailcnt = events["max"]
+	return stats, nil
+}
+
 // NumCPU returns the number of CPUs configured in 'cpuset/cpuset.cpus'.
 func (c *cgroupV2) NumCPU() (int, error) {
 	cpuset, err := getValue(c.MakePath(""), "cpuset.cpus.effective")
@@ -505,7 +625,7 @@ func (*memory2) set(spec *specs.LinuxResources, path string) error {
 
 		swap, err := convertMemorySwapToCgroupV2Value(*spec.Memory.Swap, *spec.Memory.Limit)
 		if err != nil {
-			return nil
+			return err
 		}
 		swapStr := numToStr(swap)
 		// memory and memorySwap set to the same value -- disable swap
@@ -15,9 +15,12 @@
 package cgroup
 
 import (
+	"errors"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -356,3 +359,160 @@ func TestParseCPUQuota(t *testing.T) {
 		}
 	}
 }
+
+func TestUnified(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		unified map[string]string
+		wants   map[string]string
+		err     error
+	}{
+		{
+			name: "simple",
+			unified: map[string]string{
+				"memory.high": "1000",
+				"cpu.weight":  "50",
+			},
+			wants: map[string]string{
+				"memory.high": "1000",
+				"cpu.weight":  "50",
+			},
+		},
+		{
+			name: "path",
+			unified: map[string]string{
+				"../memory.high": "1000",
+			},
+			err: ErrBadResourceSpec,
+		},
+		{
+			name: "missing controller",
+			unified: map[string]string{
+				"rdma.max": "max",
+			},
+			err: ErrBadResourceSpec,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "cgroup")
+			if err != nil {
+				t.Fatalf("error creating temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			if err := createDir(dir, tc.wants); err != nil {
+				t.Fatalf("createDir(): %v", err)
+			}
+			err = setUnified(dir, tc.unified, []string{"cpu", "memory"})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("setUnified() wrong error, got: %v, want: %v", err, tc.err)
+			}
+			if err == nil {
+				checkDir(t, dir, tc.wants)
+			}
+		})
+	}
+}
+
+func TestStatsV2(t *testing.T) {
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "cgroup")
+	if err != nil {
+		t.Fatalf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"cpu.stat":            "usage_usec 3000\nuser_usec 2000\nsystem_usec 1000\n",
+		"memory.current":      "4096\n",
+		"memory.max":          "max\n",
+		"memory.swap.current": "1024\n",
+		"memory.swap.max":     "max\n",
+		"memory.stat":         "anon 1024\nfile 2048\n",
+		"memory.events":       "low 0\nhigh 0\nmax 5\noom 1\noom_kill 1\n",
+		"pids.current":        "3\n",
+		"pids.max":            "100\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile(%q): %v", name, err)
+		}
+	}
+
+	cg := &cgroupV2{Mountpoint: dir}
+	got, err := cg.Stats()
+	if err != nil {
+		t.Fatalf("Stats(): %v", err)
+	}
+	want := &Stats{
+		CPUUsage:      3000000,
+		CPUUser:       2000000,
+		CPUKernel:     1000000,
+		MemoryUsage:   4096,
+		MemoryLimit:   math.MaxUint64,
+		MemoryFailcnt: 5,
+		MemoryCache:   2048,
+		SwapUsage:     5120,
+		SwapLimit:     math.MaxUint64,
+		MemoryStat:    map[string]uint64{"anon": 1024, "file": 2048},
+		PidsCurrent:   3,
+		PidsLimit:     100,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want: %+v", got, want)
+	}
+
+	usage, err := cg.CPUUsage()
+	if err != nil {
+		t.Fatalf("CPUUsage(): %v", err)
+	}
+	if usage != want.CPUUsage {
+		t.Errorf("CPUUsage() = %d, want: %d", usage, want.CPUUsage)
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		subtree string
+		leaf    bool
+	}{
+		{
+			name: "no subtree controllers",
+			leaf: false,
+		},
+		{
+			name:    "subtree controllers",
+			subtree: "cpu memory",
+			leaf:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "cgroup")
+			if err != nil {
+				t.Fatalf("error creating temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(dir, subtreeControl), []byte(tc.subtree), 0644); err != nil {
+				t.Fatalf("WriteFile(): %v", err)
+			}
+
+			cg := &cgroupV2{Mountpoint: dir}
+			got, err := cg.joinPath()
+			if err != nil {
+				t.Fatalf("joinPath(): %v", err)
+			}
+			want := dir
+			if tc.leaf {
+				want = filepath.Join(dir, leafCgroup)
+				if _, err := os.Stat(want); err != nil {
+					t.Errorf("leaf cgroup not created: %v", err)
+				}
+				if len(cg.Own) != 1 || cg.Own[0] != want {
+					t.Errorf("Own = %v, want: [%s]", cg.Own, want)
+				}
+			}
+			if got != want {
+				t.Errorf("joinPath() = %q, want: %q", got, want)
+			}
+		})
+	}
+}
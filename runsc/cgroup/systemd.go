@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -55,6 +56,24 @@ type cgroupSystemd struct {
 
 	properties []systemdDbus.Property
 	dbusConn   *systemdDbus.Conn
+
+	// unified holds the unified resources that don't map to a unit property,
+	// which are written to the cgroup once the unit is started.
+	unified map[string]string
+}
+
+// unifiedProperties maps cgroup v2 files that can be set through
+// LinuxResources.Unified to the unit properties that control them. Values of
+// these files are all numbers or "max".
+var unifiedProperties = map[string]string{
+	"cpu.weight":      "CPUWeight",
+	"io.weight":       "IOWeight",
+	"memory.high":     "MemoryHigh",
+	"memory.low":      "MemoryLow",
+	"memory.max":      "MemoryMax",
+	"memory.min":      "MemoryMin",
+	"memory.swap.max": "MemorySwapMax",
+	"pids.max":        "TasksMax",
 }
 
 func newCgroupV2Systemd(cgv2 *cgroupV2) (*cgroupSystemd, error) {
@@ -135,6 +154,33 @@ func (c *cgroupSystemd) Install(res *specs.LinuxResources) error {
 			return fmt.Errorf("mandatory cgroup controller %q is missing for %q", controllerName, c.Path)
 		}
 	}
+	if res != nil {
+		return c.addUnifiedProps(res.Unified)
+	}
+	return nil
+}
+
+// addUnifiedProps adds the unit properties for unified resources, and saves
+// the ones that systemd doesn't know about to be set in Join.
+func (c *cgroupSystemd) addUnifiedProps(unified map[string]string) error {
+	for name, value := range unified {
+		prop, ok := unifiedProperties[name]
+		if !ok {
+			if c.unified == nil {
+				c.unified = make(map[string]string)
+			}
+			c.unified[name] = value
+			continue
+		}
+		v := uint64(math.MaxUint64)
+		if value = strings.TrimSpace(value); value != "max" {
+			var err error
+			if v, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return fmt.Errorf("%w: unified resource %q has invalid value %q: %v", ErrBadResourceSpec, name, value, err)
+			}
+		}
+		c.addProp(prop, v)
+	}
 	return nil
 }
 
@@ -189,6 +235,9 @@ func (c *cgroupSystemd) Join() (func(), error) {
 	if _, err = c.createCgroupPaths(); err != nil {
 		return nil, err
 	}
+	if err := setUnified(c.MakePath(""), c.unified, c.Controllers); err != nil {
+		return nil, err
+	}
 	return clean.Release(), nil
 }
 
@@ -18,6 +18,7 @@ package cgroup
 
 import (
 	"errors"
+	"math"
 	"testing"
 
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
@@ -209,6 +210,29 @@ func TestInstall(t *testing.T) {
 				{"IOWriteIOPSMax", dbus.MakeVariant("20:21 22")},
 			},
 		},
+		{
+			name: "unified",
+			res: &specs.LinuxResources{
+				Unified: map[string]string{
+					"memory.high": "1000",
+					"pids.max":    "max",
+					"cpu.idle":    "1",
+				},
+			},
+			wantProps: []systemdDbus.Property{
+				{"MemoryHigh", dbus.MakeVariant(uint64(1000))},
+				{"TasksMax", dbus.MakeVariant(uint64(math.MaxUint64))},
+			},
+		},
+		{
+			name: "unified invalid",
+			res: &specs.LinuxResources{
+				Unified: map[string]string{
+					"memory.high": "1k",
+				},
+			},
+			err: ErrBadResourceSpec,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			cg := cgroupSystemd{Name: "123", Parent: "parent.slice"}
@@ -71,10 +71,15 @@ func Main(version string) {
 	subcommands.Register(new(cmd.Do), "")
 	subcommands.Register(new(cmd.Events), "")
 	subcommands.Register(new(cmd.Exec), "")
+	subcommands.Register(new(cmd.IOMax), "")
 	subcommands.Register(new(cmd.Kill), "")
 	subcommands.Register(new(cmd.List), "")
+	subcommands.Register(new(cmd.Migrate), "")
 	subcommands.Register(new(cmd.PS), "")
 	subcommands.Register(new(cmd.Pause), "")
+	subcommands.Register(new(cmd.RecoverGofer), "")
+	subcommands.Register(new(cmd.Resize), "")
+	subcommands.Register(new(cmd.ResizeTTY), "")
 	subcommands.Register(new(cmd.Restore), "")
 	subcommands.Register(new(cmd.Resume), "")
 	subcommands.Register(new(cmd.Run), "")
@@ -85,9 +90,14 @@ func Main(version string) {
 
 	// Helpers.
 	const helperGroup = "helpers"
+	subcommands.Register(new(cmd.AttachNIC), helperGroup)
+	subcommands.Register(new(cmd.Bandwidth), helperGroup)
+	subcommands.Register(new(cmd.Cp), helperGroup)
 	subcommands.Register(new(cmd.Install), helperGroup)
 	subcommands.Register(new(cmd.Mitigate), helperGroup)
 	subcommands.Register(new(cmd.Uninstall), helperGroup)
+	subcommands.Register(new(cmd.VerifyBundle), helperGroup)
+	subcommands.Register(new(cmd.VerityMeasure), helperGroup)
 	subcommands.Register(new(trace.Trace), helperGroup)
 
 	const debugGroup = "debug"
@@ -223,7 +233,7 @@ func Main(version string) {
 	log.Infof("Configuration:")
 	log.Infof("\t\tRootDir: %s", conf.RootDir)
 	log.Infof("\t\tPlatform: %v", conf.Platform)
-	log.Infof("\t\tFileAccess: %v, overlay: %t", conf.FileAccess, conf.Overlay)
+	log.Infof("\t\tFileAccess: %v, overlay: %t, overlay2: %s", conf.FileAccess, conf.Overlay, conf.Overlay2)
 	log.Infof("\t\tNetwork: %v, logging: %t", conf.Network, conf.LogPackets)
 	log.Infof("\t\tStrace: %t, max size: %d, syscalls: %s", conf.Strace, conf.StraceLogSize, conf.StraceSyscalls)
 	log.Infof("\t\tLISAFS: %t", conf.Lisafs)
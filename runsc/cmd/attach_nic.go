@@ -0,0 +1,87 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// AttachNIC implements subcommands.Command for the "attach-nic" command.
+type AttachNIC struct {
+	detach bool
+}
+
+// Name implements subcommands.Command.Name.
+func (*AttachNIC) Name() string {
+	return "attach-nic"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*AttachNIC) Synopsis() string {
+	return "attach a network interface to a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*AttachNIC) Usage() string {
+	return `attach-nic [flags] <container id> <interface> - attach a network interface to a running sandbox.
+
+The interface must have been added to the network namespace of the sandbox,
+e.g. by a CNI plugin, after the sandbox started. Like the interfaces present
+when the sandbox starts, its addresses are moved from the host into the
+sandbox. With --detach, the interface is removed from the sandbox instead.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (a *AttachNIC) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&a.detach, "detach", false, "remove the interface from the sandbox instead of attaching it")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (a *AttachNIC) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	name := f.Arg(1)
+	conf := args[0].(*config.Config)
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if !c.IsSandboxRunning() {
+		util.Fatalf("container sandbox is not running")
+	}
+
+	if a.detach {
+		if err := c.Sandbox.DetachNIC(name); err != nil {
+			util.Fatalf("detach-nic failed: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+	if err := c.Sandbox.AttachNIC(name, conf); err != nil {
+		util.Fatalf("attach-nic failed: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
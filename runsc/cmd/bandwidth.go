@@ -0,0 +1,167 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/tcpip/link/shaper"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// Bandwidth implements subcommands.Command for the "bandwidth" command.
+type Bandwidth struct{}
+
+// Name implements subcommands.Command.Name.
+func (*Bandwidth) Name() string {
+	return "bandwidth"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Bandwidth) Synopsis() string {
+	return "manages the bandwidth limits of a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Bandwidth) Usage() string {
+	buf := bytes.Buffer{}
+	buf.WriteString("Usage: bandwidth <subcommand> <subcommand args>\n\n")
+
+	cdr := createBandwidthCommander(&flag.FlagSet{})
+	cdr.VisitGroups(func(grp *subcommands.CommandGroup) {
+		cdr.ExplainGroup(&buf, grp)
+	})
+
+	return buf.String()
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*Bandwidth) SetFlags(*flag.FlagSet) {}
+
+// Execute implements subcommands.Command.Execute.
+func (*Bandwidth) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	return createBandwidthCommander(f).Execute(ctx, args...)
+}
+
+func createBandwidthCommander(f *flag.FlagSet) *subcommands.Commander {
+	cdr := subcommands.NewCommander(f, "bandwidth")
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(cdr.FlagsCommand(), "")
+	cdr.Register(new(bandwidthSet), "")
+	return cdr
+}
+
+// bandwidthSet implements subcommands.Command for the "bandwidth set" command.
+type bandwidthSet struct {
+	ingress      string
+	ingressBurst string
+	egress       string
+	egressBurst  string
+}
+
+// Name implements subcommands.Command.Name.
+func (*bandwidthSet) Name() string {
+	return "set"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*bandwidthSet) Synopsis() string {
+	return "changes the bandwidth limits of a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*bandwidthSet) Usage() string {
+	return `set [flags] <container id> - changes the bandwidth limits of a running sandbox.
+
+Limits the rate of the traffic received (--ingress) and sent (--egress) on each
+of the external interfaces of the sandbox, e.g.:
+
+	runsc bandwidth set <container id> --egress 100mbit --ingress 50mbit
+
+Rates are Kubernetes quantities of bits per second (e.g. "10M") or rates with
+a tc unit (e.g. "100mbit" or "1mbps"), and "0" removes the limit. Bursts are
+sizes in bytes with a tc unit (e.g. "64kb"); they default to the number of
+bytes sent in 10ms at the rate. The limit of a direction that isn't given is
+not changed.
+
+Packets that exceed the limits are queued, and only dropped when the queue is
+full. The initial limits may be given by the "kubernetes.io/ingress-bandwidth"
+and "kubernetes.io/egress-bandwidth" annotations, and the current limits and
+counters are reported by "runsc debug --network".
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (b *bandwidthSet) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&b.ingress, "ingress", "", "rate limit of the received traffic")
+	f.StringVar(&b.ingressBurst, "ingress-burst", "", "burst of the received traffic, requires --ingress")
+	f.StringVar(&b.egress, "egress", "", "rate limit of the sent traffic")
+	f.StringVar(&b.egressBurst, "egress-burst", "", "burst of the sent traffic, requires --egress")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (b *bandwidthSet) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 || b.ingress == "" && b.egress == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	ingress, err := parseLimitFlags("ingress", b.ingress, b.ingressBurst)
+	if err != nil {
+		util.Fatalf("%v", err)
+	}
+	egress, err := parseLimitFlags("egress", b.egress, b.egressBurst)
+	if err != nil {
+		util.Fatalf("%v", err)
+	}
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if !c.IsSandboxRunning() {
+		util.Fatalf("container sandbox is not running")
+	}
+	if err := c.Sandbox.SetBandwidth(ingress, egress); err != nil {
+		util.Fatalf("setting bandwidth limits: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// parseLimitFlags parses the rate and burst flags of direction dir. It returns
+// nil if the rate isn't given.
+func parseLimitFlags(dir, rate, burst string) (*shaper.Limit, error) {
+	if rate == "" {
+		if burst != "" {
+			return nil, fmt.Errorf("--%s-burst requires --%s", dir, dir)
+		}
+		return nil, nil
+	}
+	limit, err := boot.ParseBandwidthLimit(rate, burst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %v", dir, err)
+	}
+	return &limit, nil
+}
@@ -27,6 +27,7 @@ import (
 	"gvisor.dev/gvisor/pkg/coretag"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/sentry/watchdog"
 	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/cmd/util"
 	"gvisor.dev/gvisor/runsc/config"
@@ -35,6 +36,10 @@ import (
 	"gvisor.dev/gvisor/runsc/specutils"
 )
 
+// watchdogLogSize is the amount of sentry log, in bytes, included in the
+// watchdog diagnostic bundle.
+const watchdogLogSize = 1 << 20
+
 // Boot implements subcommands.Command for the "boot" command which starts a
 // new sandbox. It should not be called directly.
 type Boot struct {
@@ -48,6 +53,26 @@ type Boot struct {
 	// control server that is donated to this process.
 	controllerFD int
 
+	// metricServerFD is the file descriptor of a stream socket for the
+	// metric server that is donated to this process, or -1.
+	metricServerFD int
+
+	// connectPolicyFD is the file descriptor of a stream socket connected to
+	// the connect policy server.
+	connectPolicyFD int
+
+	// vsockListenFD is the file descriptor of the socket listening for vsock
+	// connections from the host, or -1.
+	vsockListenFD int
+
+	// vsockDirFD is the file descriptor of the directory containing the
+	// vsock socket, or -1.
+	vsockDirFD int
+
+	// swapFD is the file descriptor of the swap file created in the
+	// --swap-dir directory, or -1.
+	swapFD int
+
 	// deviceFD is the file descriptor for the platform device file.
 	deviceFD int
 
@@ -85,6 +110,10 @@ type Boot struct {
 
 	podInitConfigFD int
 
+	// compatPolicyFD is the file descriptor of the --compat-policy file, or
+	// -1.
+	compatPolicyFD int
+
 	sinkFDs intFlags
 
 	// pidns is set if the sandbox is in its own pid namespace.
@@ -101,6 +130,10 @@ type Boot struct {
 
 	// FDs for profile data.
 	profileFDs profile.FDArgs
+
+	// watchdogBundleFD is the file descriptor to write the watchdog
+	// diagnostic bundle to, or -1.
+	watchdogBundleFD int
 }
 
 // Name implements subcommands.Command.Name.
@@ -132,6 +165,11 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	// Open FDs that are donated to the sandbox.
 	f.IntVar(&b.specFD, "spec-fd", -1, "required fd with the container spec")
 	f.IntVar(&b.controllerFD, "controller-fd", -1, "required FD of a stream socket for the control server that must be donated to this process")
+	f.IntVar(&b.metricServerFD, "metric-server-fd", -1, "FD of a stream socket on which to serve metrics in the Prometheus text exposition format")
+	f.IntVar(&b.connectPolicyFD, "connect-policy-fd", -1, "FD of a stream socket connected to the connect policy server.")
+	f.IntVar(&b.vsockListenFD, "vsock-listen-fd", -1, "FD of a stream socket listening for vsock connections from the host.")
+	f.IntVar(&b.vsockDirFD, "vsock-dir-fd", -1, "FD of the directory containing the vsock socket.")
+	f.IntVar(&b.swapFD, "swap-fd", -1, "FD of the swap file for the sentry's memory")
 	f.IntVar(&b.deviceFD, "device-fd", -1, "FD for the platform device file")
 	f.Var(&b.ioFDs, "io-fds", "list of FDs to connect gofer clients. They must follow this order: root first, then mounts as defined in the spec")
 	f.Var(&b.stdioFDs, "stdio-fds", "list of FDs containing sandbox stdin, stdout, and stderr in that order")
@@ -139,7 +177,9 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&b.startSyncFD, "start-sync-fd", -1, "required FD to used to synchronize sandbox startup")
 	f.IntVar(&b.mountsFD, "mounts-fd", -1, "mountsFD is the file descriptor to read list of mounts after they have been resolved (direct paths, no symlinks).")
 	f.IntVar(&b.podInitConfigFD, "pod-init-config-fd", -1, "file descriptor to the pod init configuration file.")
+	f.IntVar(&b.compatPolicyFD, "compat-policy-fd", -1, "file descriptor to the compat policy file.")
 	f.Var(&b.sinkFDs, "sink-fds", "ordered list of file descriptors to be used by the sinks defined in --pod-init-config.")
+	f.IntVar(&b.watchdogBundleFD, "watchdog-bundle-fd", -1, "file descriptor to write the watchdog diagnostic bundle to.")
 
 	// Profiling flags.
 	b.profileFDs.SetFromFlags(f)
@@ -294,6 +334,26 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		PodInitConfigFD: b.podInitConfigFD,
 		SinkFDs:         b.sinkFDs.GetArray(),
 		ProfileOpts:     b.profileFDs.ToOpts(),
+		MetricServerFD:  b.metricServerFD,
+		ConnectPolicyFD: b.connectPolicyFD,
+		VsockListenFD:   b.vsockListenFD,
+		VsockDirFD:      b.vsockDirFD,
+		CompatPolicyFD:  b.compatPolicyFD,
+		SwapFD:          b.swapFD,
+	}
+	if conf.LogRingSize > 0 {
+		// Keep recent log statements in memory to be dumped or followed
+		// through the control server.
+		bootArgs.LogRing = log.NewRingEmitter(conf.LogRingSize)
+		log.SetTarget(&log.MultiEmitter{log.Log().Emitter, bootArgs.LogRing})
+	}
+	if conf.WatchdogAction&watchdog.Bundle != 0 {
+		// Keep the tail of the sentry log to include it in the bundle.
+		bootArgs.WatchdogLog = log.NewRingBuffer(watchdogLogSize)
+		log.SetTarget(&log.MultiEmitter{log.Log().Emitter, log.GoogleEmitter{&log.Writer{Next: bootArgs.WatchdogLog}}})
+		if b.watchdogBundleFD != -1 {
+			bootArgs.WatchdogBundle = os.NewFile(uintptr(b.watchdogBundleFD), "watchdog bundle file")
+		}
 	}
 	l, err := boot.New(bootArgs)
 	if err != nil {
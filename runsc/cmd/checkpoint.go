@@ -16,26 +16,34 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/google/subcommands"
-	"golang.org/x/sys/unix"
-	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/state/statefile"
 	"gvisor.dev/gvisor/runsc/cmd/util"
 	"gvisor.dev/gvisor/runsc/config"
-	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
-	"gvisor.dev/gvisor/runsc/specutils"
+	"gvisor.dev/gvisor/runsc/lib"
+	"gvisor.dev/gvisor/runsc/remote"
 )
 
 // File containing the container's saved image/state within the given image-path's directory.
 const checkpointFileName = "checkpoint.img"
 
+// File containing the contents of the container's memory within the given
+// image-path's directory.
+const pagesFileName = "pages.img"
+
 // Checkpoint implements subcommands.Command for the "checkpoint" command.
 type Checkpoint struct {
-	imagePath    string
-	leaveRunning bool
+	imagePath       string
+	imageFD         int
+	encryptionKeyFD int
+	leaveRunning    bool
+	resumeUpload    string
 }
 
 // Name implements subcommands.Command.Name.
@@ -51,13 +59,40 @@ func (*Checkpoint) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Checkpoint) Usage() string {
 	return `checkpoint [flags] <container id> - save current state of container.
+
+The state is saved to the image directory given by --image-path, or streamed
+to the file descriptor given by --image-fd without being written to local
+disk, e.g.:
+
+	runsc checkpoint --image-fd=1 <container id> | curl -s -T - https://example.com/checkpoint.img
+
+Streamed images contain the contents of memory inline, so they can't be
+restored with --lazy-pages.
+
+If --image-path is an http:// or https:// URL, the image is saved to a
+temporary directory and then uploaded in chunks to objects under that URL,
+along with a manifest of their hashes. If the upload fails, the temporary
+directory is kept, and the upload can be retried without checkpointing the
+container again with --resume-upload, which skips chunks that were already
+uploaded, e.g.:
+
+	runsc checkpoint --image-path=https://example.com/images/foo <container id>
+	runsc checkpoint --image-path=https://example.com/images/foo --resume-upload=/tmp/runsc-checkpoint-123 <container id>
+
+If --encryption-key-fd is given, the image is encrypted and authenticated with
+the 32-byte key read from that file descriptor, and the same key must be
+passed to restore. Encrypted images always contain the contents of memory
+inline, so that it is protected too.
 `
 }
 
 // SetFlags implements subcommands.Command.SetFlags.
 func (c *Checkpoint) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.imagePath, "image-path", "", "directory path to saved container image")
-	f.BoolVar(&c.leaveRunning, "leave-running", false, "restart the container after checkpointing")
+	f.IntVar(&c.imageFD, "image-fd", -1, "file descriptor to stream the container image to, e.g. a pipe; incompatible with image-path")
+	f.IntVar(&c.encryptionKeyFD, "encryption-key-fd", -1, "file descriptor to read a 32-byte key from, which the container image is encrypted with")
+	f.BoolVar(&c.leaveRunning, "leave-running", false, "keep the container running after checkpointing")
+	f.StringVar(&c.resumeUpload, "resume-upload", "", "directory kept by a failed upload to an image-path URL, to retry uploading instead of checkpointing the container")
 
 	// Unimplemented flags necessary for compatibility with docker.
 	var wp string
@@ -74,86 +109,124 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...interfa
 
 	id := f.Arg(0)
 	conf := args[0].(*config.Config)
-	waitStatus := args[1].(*unix.WaitStatus)
 
-	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	cont, err := lib.Load(conf, id)
 	if err != nil {
 		util.Fatalf("loading container: %v", err)
 	}
 
+	var key []byte
+	if c.encryptionKeyFD >= 0 {
+		key, err = readEncryptionKey(c.encryptionKeyFD)
+		if err != nil {
+			util.Fatalf("%v", err)
+		}
+	}
+
+	if c.imageFD >= 0 {
+		if c.imagePath != "" {
+			util.Fatalf("image-path and image-fd flags are mutually exclusive")
+		}
+		// Memory is saved inline rather than to a separate pages file, so
+		// that the whole image is a single sequential stream.
+		image := os.NewFile(uintptr(c.imageFD), "checkpoint image")
+		defer image.Close()
+		if err := cont.Checkpoint(image, nil /* pagesFile */, key, c.leaveRunning); err != nil {
+			util.Fatalf("checkpoint failed: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+
 	if c.imagePath == "" {
-		util.Fatalf("image-path flag must be provided")
+		util.Fatalf("image-path or image-fd flag must be provided")
+	}
+
+	if remote.IsURL(c.imagePath) {
+		if err := c.checkpointToURL(cont, key); err != nil {
+			util.Fatalf("%v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+	if c.resumeUpload != "" {
+		util.Fatalf("resume-upload requires image-path to be a URL")
 	}
 
 	if err := os.MkdirAll(c.imagePath, 0755); err != nil {
 		util.Fatalf("making directories at path provided: %v", err)
 	}
+	if err := c.checkpointToDir(cont, c.imagePath, key); err != nil {
+		util.Fatalf("%v", err)
+	}
+
+	return subcommands.ExitSuccess
+}
 
-	fullImagePath := filepath.Join(c.imagePath, checkpointFileName)
+// checkpointToDir saves the image of cont to the local directory dir.
+func (c *Checkpoint) checkpointToDir(cont *lib.Container, dir string, key []byte) error {
+	fullImagePath := filepath.Join(dir, checkpointFileName)
 
 	// Create the image file and open for writing.
 	file, err := os.OpenFile(fullImagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
 	if err != nil {
-		util.Fatalf("os.OpenFile(%q) failed: %v", fullImagePath, err)
+		return fmt.Errorf("os.OpenFile(%q) failed: %v", fullImagePath, err)
 	}
 	defer file.Close()
 
-	if err := cont.Checkpoint(file); err != nil {
-		util.Fatalf("checkpoint failed: %v", err)
+	// The contents of memory can only be encrypted inline.
+	var pagesFile *os.File
+	if key == nil {
+		fullPagesPath := filepath.Join(dir, pagesFileName)
+		pagesFile, err = os.OpenFile(fullPagesPath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+		if err != nil {
+			return fmt.Errorf("os.OpenFile(%q) failed: %v", fullPagesPath, err)
+		}
+		defer pagesFile.Close()
 	}
 
-	if !c.leaveRunning {
-		return subcommands.ExitSuccess
-	}
-
-	// TODO(b/110843694): Make it possible to restore into same container.
-	// For now, we can fake it by destroying the container and making a
-	// new container with the same ID. This hack does not work with docker
-	// which uses the container pid to ensure that the restore-container is
-	// actually the same as the checkpoint-container. By restoring into
-	// the same container, we will solve the docker incompatibility.
-
-	// Restore into new container with same ID.
-	bundleDir := cont.BundleDir
-	if bundleDir == "" {
-		util.Fatalf("setting bundleDir")
+	if err := cont.Checkpoint(file, pagesFile, key, c.leaveRunning); err != nil {
+		return fmt.Errorf("checkpoint failed: %v", err)
 	}
+	return nil
+}
 
-	spec, err := specutils.ReadSpec(bundleDir, conf)
+// checkpointToURL saves the image of cont to a temporary directory, and
+// uploads it to the URL c.imagePath. The directory is kept if the upload
+// fails, so that it can be resumed with c.resumeUpload.
+func (c *Checkpoint) checkpointToURL(cont *lib.Container, key []byte) error {
+	store, err := remote.NewStore(c.imagePath)
 	if err != nil {
-		util.Fatalf("reading spec: %v", err)
+		return err
 	}
-
-	specutils.LogSpec(spec)
-
-	if cont.ConsoleSocket != "" {
-		log.Warningf("ignoring console socket since it cannot be restored")
+	dir := c.resumeUpload
+	if dir != "" {
+		store.Resume = true
+	} else {
+		dir, err = os.MkdirTemp("", "runsc-checkpoint-")
+		if err != nil {
+			return fmt.Errorf("creating temporary image directory: %v", err)
+		}
+		if err := c.checkpointToDir(cont, dir, key); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
 	}
-
-	if err := cont.Destroy(); err != nil {
-		util.Fatalf("destroying container: %v", err)
+	if err := store.UploadDir(context.Background(), dir, []string{checkpointFileName, pagesFileName}); err != nil {
+		return fmt.Errorf("uploading image, which was kept in %q for --resume-upload: %v", dir, err)
 	}
+	return os.RemoveAll(dir)
+}
 
-	contArgs := container.Args{
-		ID:        id,
-		Spec:      spec,
-		BundleDir: bundleDir,
-	}
-	cont, err = container.New(conf, contArgs)
+// readEncryptionKey reads a checkpoint image encryption key from the given
+// host file descriptor, which it closes.
+func readEncryptionKey(fd int) ([]byte, error) {
+	f := os.NewFile(uintptr(fd), "encryption key")
+	defer f.Close()
+	key, err := io.ReadAll(io.LimitReader(f, statefile.EncryptionKeySize+1))
 	if err != nil {
-		util.Fatalf("restoring container: %v", err)
+		return nil, fmt.Errorf("reading encryption key: %v", err)
 	}
-	defer cont.Destroy()
-
-	if err := cont.Restore(spec, conf, fullImagePath); err != nil {
-		util.Fatalf("starting container: %v", err)
+	if len(key) != statefile.EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be exactly %d bytes long", statefile.EncryptionKeySize)
 	}
-
-	ws, err := cont.Wait()
-	if err != nil {
-		util.Fatalf("Error waiting for container: %v", err)
-	}
-	*waitStatus = ws
-
-	return subcommands.ExitSuccess
+	return key, nil
 }
@@ -0,0 +1,348 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// Cp implements subcommands.Command for the "cp" command.
+type Cp struct{}
+
+// Name implements subcommands.Command.Name.
+func (*Cp) Name() string {
+	return "cp"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Cp) Synopsis() string {
+	return "copy files and directories between a container and the host"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Cp) Usage() string {
+	return `cp <container id>:<src path> <dst path>
+cp <src path> <container id>:<dst path>
+
+Copies a file, directory or symbolic link between a container and the host.
+Directories are copied recursively. Paths in the container are resolved in the
+mount namespace and with the credentials of the container's init process. File
+modes and timestamps are preserved; ownership is preserved to the extent that
+the credentials allow, which requires running as root when copying to the host.
+
+If the destination is an existing directory, the source is copied into it.
+Otherwise, the source is copied to the destination path. Host paths containing
+a colon must start with "/" or "./".
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*Cp) SetFlags(*flag.FlagSet) {
+}
+
+// Execute implements subcommands.Command.Execute.
+func (*Cp) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	conf := args[0].(*config.Config)
+
+	srcID, src := parseCpArg(f.Arg(0))
+	dstID, dst := parseCpArg(f.Arg(1))
+	if (srcID == "") == (dstID == "") {
+		util.Fatalf("exactly one of the source and destination must be in a container")
+	}
+	id := srcID + dstID
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+
+	// Files are streamed between the sandbox and this process through a
+	// pipe, so memory usage doesn't depend on their size.
+	r, w, err := os.Pipe()
+	if err != nil {
+		util.Fatalf("creating pipe: %v", err)
+	}
+	errCh := make(chan error, 1)
+	if srcID != "" {
+		go func() {
+			errCh <- c.CopyOut(src, w)
+			w.Close()
+		}()
+		err = extractTar(dst, r)
+		// Unblock the sandbox if extraction failed before reading the
+		// whole stream.
+		r.Close()
+		if cerr := <-errCh; cerr != nil {
+			util.Fatalf("copy failed: %v", cerr)
+		}
+	} else {
+		go func() {
+			err := writeTar(src, w)
+			w.Close()
+			errCh <- err
+		}()
+		err = c.CopyIn(dst, r)
+		// Unblock writeTar if the sandbox failed before reading the whole
+		// stream.
+		r.Close()
+		if werr := <-errCh; err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		util.Fatalf("copy failed: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// parseCpArg parses a runsc cp argument, returning the container ID and the
+// path. The container ID is empty for host paths.
+func parseCpArg(arg string) (string, string) {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") {
+		return "", arg
+	}
+	if i := strings.IndexByte(arg, ':'); i > 0 {
+		return arg[:i], arg[i+1:]
+	}
+	return "", arg
+}
+
+// writeTar writes the file or directory at src to w as a tar stream, in the
+// format written by control.CopyOut.
+func writeTar(src string, w io.Writer) error {
+	name := filepath.Base(filepath.Clean(src))
+	if name == "/" || name == "." {
+		return fmt.Errorf("can't copy %q, copy the files it contains instead", src)
+	}
+	tw := tar.NewWriter(w)
+	if err := writeTarEntry(tw, src, name); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeTarEntry(tw *tar.Writer, path, name string) error {
+	var stat unix.Stat_t
+	if err := unix.Lstat(path, &stat); err != nil {
+		return fmt.Errorf("stat %q: %w", path, err)
+	}
+	hdr := &tar.Header{
+		Name:       name,
+		Mode:       int64(stat.Mode &^ unix.S_IFMT),
+		Uid:        int(stat.Uid),
+		Gid:        int(stat.Gid),
+		ModTime:    time.Unix(stat.Mtim.Unix()),
+		AccessTime: time.Unix(stat.Atim.Unix()),
+		Format:     tar.FormatPAX,
+	}
+	switch stat.Mode & unix.S_IFMT {
+	case unix.S_IFREG:
+		f, err := os.OpenFile(path, os.O_RDONLY|unix.O_NOFOLLOW, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = stat.Size
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, f, hdr.Size)
+		return err
+
+	case unix.S_IFLNK:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target
+		return tw.WriteHeader(hdr)
+
+	case unix.S_IFDIR:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		// os.ReadDir returns entries sorted by name.
+		children, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := writeTarEntry(tw, filepath.Join(path, child.Name()), filepath.Join(name, child.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		log.Warningf("Not copying %q: unsupported file type %#o", path, stat.Mode&unix.S_IFMT)
+		return nil
+	}
+}
+
+// extractTar extracts the tar stream written by control.CopyOut from r to dst,
+// with the same placement rules as control.CopyIn.
+//
+// The stream comes from the sandbox and is untrusted: entries may not escape
+// the destination directory, neither through their name nor through symbolic
+// links created by earlier entries.
+func extractTar(dst string, r io.Reader) error {
+	dir, top := dst, ""
+	if fi, err := os.Stat(dst); err != nil || !fi.IsDir() {
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		dir, top = filepath.Dir(dst), filepath.Base(dst)
+	}
+
+	var dirs []*tar.Header
+	var dirPaths []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar stream: %w", err)
+		}
+		rel, err := control.CopyEntryPath(hdr.Name, top)
+		if err != nil {
+			return err
+		}
+		if err := checkNoSymlinks(dir, filepath.Dir(rel)); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, rel)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(path, 0700); err != nil {
+				if fi, serr := os.Lstat(path); !os.IsExist(err) || serr != nil || !fi.IsDir() {
+					return err
+				}
+			}
+			dirs = append(dirs, hdr)
+			dirPaths = append(dirPaths, path)
+			continue
+
+		case tar.TypeReg:
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|unix.O_NOFOLLOW, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			err := os.Symlink(hdr.Linkname, path)
+			if os.IsExist(err) {
+				if err = os.Remove(path); err == nil {
+					err = os.Symlink(hdr.Linkname, path)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+		default:
+			log.Warningf("Not copying %q: unsupported tar entry type %q", path, hdr.Typeflag)
+			continue
+		}
+		if err := setHostMetadata(path, hdr); err != nil {
+			return err
+		}
+	}
+	// Apply metadata to children before their parents, since creating
+	// entries changes the timestamps of their directory.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := setHostMetadata(dirPaths[i], dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNoSymlinks returns an error if any component of rel, relative to dir,
+// is a symbolic link.
+func checkNoSymlinks(dir, rel string) error {
+	if rel == "." {
+		return nil
+	}
+	path := dir
+	for _, c := range strings.Split(rel, "/") {
+		path = filepath.Join(path, c)
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("not copying through symbolic link %q", path)
+		}
+	}
+	return nil
+}
+
+// setHostMetadata applies the ownership, mode and timestamps in hdr to the file
+// at path without following symbolic links. Ownership is only changed when
+// running as root.
+func setHostMetadata(path string, hdr *tar.Header) error {
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	if err := unix.Chmod(path, uint32(hdr.Mode&^unix.S_IFMT)); err != nil {
+		return fmt.Errorf("chmod %q: %w", path, err)
+	}
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+	ts := []unix.Timespec{unix.NsecToTimespec(atime.UnixNano()), unix.NsecToTimespec(hdr.ModTime.UnixNano())}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return fmt.Errorf("setting times of %q: %w", path, err)
+	}
+	return nil
+}
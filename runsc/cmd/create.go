@@ -20,8 +20,8 @@ import (
 	"github.com/google/subcommands"
 	"gvisor.dev/gvisor/runsc/cmd/util"
 	"gvisor.dev/gvisor/runsc/config"
-	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/lib"
 	"gvisor.dev/gvisor/runsc/specutils"
 )
 
@@ -101,7 +101,7 @@ func (c *Create) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}
 	// Create the container. A new sandbox will be created for the
 	// container unless the metadata specifies that it should be run in an
 	// existing container.
-	contArgs := container.Args{
+	contArgs := lib.Args{
 		ID:            id,
 		Spec:          spec,
 		BundleDir:     bundleDir,
@@ -109,7 +109,7 @@ func (c *Create) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}
 		PIDFile:       c.pidFile,
 		UserLog:       c.userLog,
 	}
-	if _, err := container.New(conf, contArgs); err != nil {
+	if _, err := lib.New(conf, contArgs); err != nil {
 		return util.Errorf("creating container: %v", err)
 	}
 	return subcommands.ExitSuccess
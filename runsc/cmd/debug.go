@@ -16,6 +16,9 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strconv"
@@ -27,6 +30,7 @@ import (
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/cmd/util"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/container"
@@ -35,20 +39,36 @@ import (
 
 // Debug implements subcommands.Command for the "debug" command.
 type Debug struct {
-	pid          int
-	stacks       bool
-	signal       int
-	profileBlock string
-	profileCPU   string
-	profileHeap  string
-	profileMutex string
-	trace        string
-	strace       string
-	logLevel     string
-	logPackets   string
-	delay        time.Duration
-	duration     time.Duration
-	ps           bool
+	pid                  int
+	stacks               bool
+	signal               int
+	profileBlock         string
+	profileCPU           string
+	profileHeap          string
+	profileMutex         string
+	profileBlockRate     int
+	profileMutexFraction int
+	trace                string
+	strace               string
+	logLevel             string
+	logPackets           string
+	logSubsystems        string
+	dumpLogs             bool
+	followLogs           bool
+	delay                time.Duration
+	duration             time.Duration
+	ps                   bool
+	network              bool
+	conntrack            bool
+	compatReport         bool
+	memory               bool
+	metrics              bool
+	fds                  bool
+	realtimeOffset       string
+	advanceTime          time.Duration
+	advanceToNextTimer   bool
+	waitIdle             bool
+	idleTimeout          time.Duration
 }
 
 // Name implements subcommands.Command.
@@ -74,14 +94,30 @@ func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&d.profileCPU, "profile-cpu", "", "writes CPU profile to the given file.")
 	f.StringVar(&d.profileHeap, "profile-heap", "", "writes heap profile to the given file.")
 	f.StringVar(&d.profileMutex, "profile-mutex", "", "writes mutex profile to the given file.")
+	f.IntVar(&d.profileBlockRate, "profile-block-rate", control.DefaultBlockProfileRate, "block profile rate to use with -profile-block, see runtime.SetBlockProfileRate.")
+	f.IntVar(&d.profileMutexFraction, "profile-mutex-fraction", control.DefaultMutexProfileRate, "mutex profile fraction to use with -profile-mutex, see runtime.SetMutexProfileFraction.")
 	f.DurationVar(&d.delay, "delay", time.Hour, "amount of time to delay for collecting heap and goroutine profiles.")
-	f.DurationVar(&d.duration, "duration", time.Hour, "amount of time to wait for CPU and trace profiles.")
+	f.DurationVar(&d.duration, "duration", time.Hour, "amount of time to wait for CPU, block, mutex and trace profiles.")
 	f.StringVar(&d.trace, "trace", "", "writes an execution trace to the given file.")
 	f.IntVar(&d.signal, "signal", -1, "sends signal to the sandbox")
 	f.StringVar(&d.strace, "strace", "", `A comma separated list of syscalls to trace. "all" enables all traces, "off" disables all.`)
 	f.StringVar(&d.logLevel, "log-level", "", "The log level to set: warning (0), info (1), or debug (2).")
 	f.StringVar(&d.logPackets, "log-packets", "", "A boolean value to enable or disable packet logging: true or false.")
+	f.StringVar(&d.logSubsystems, "log-subsystems", "", `A comma separated list of subsystems to log debug and info statements for: kernel, gofer, netstack, platform or other. "all" logs all subsystems.`)
+	f.BoolVar(&d.dumpLogs, "dump-logs", false, "writes the recent sentry log statements kept in memory to stdout, see --log-ring-size")
+	f.BoolVar(&d.followLogs, "follow-logs", false, "streams sentry log statements to stdout as they are emitted, until interrupted")
 	f.BoolVar(&d.ps, "ps", false, "lists processes")
+	f.BoolVar(&d.network, "network", false, "dumps network stack counters and state as JSON to stdout")
+	f.BoolVar(&d.conntrack, "conntrack", false, "dumps the connection tracking table used for NAT as JSON to stdout")
+	f.BoolVar(&d.compatReport, "compat-report", false, "dumps the unimplemented syscalls invoked in the sandbox with their call counts as JSON to stdout. Requires --compat-tracking")
+	f.BoolVar(&d.memory, "memory", false, "dumps a breakdown of the sandbox memory usage as JSON to stdout")
+	f.BoolVar(&d.metrics, "metrics", false, "dumps a snapshot of the sandbox metrics in the Prometheus text format to stdout")
+	f.BoolVar(&d.fds, "fds", false, "dumps the FD tables, mount tables and working directories of all tasks as a stream of JSON objects to stdout")
+	f.StringVar(&d.realtimeOffset, "realtime-offset", "", "sets the offset of the sandbox's CLOCK_REALTIME from the host's, as a duration, e.g. 8760h. The host's clock is unaffected.")
+	f.DurationVar(&d.advanceTime, "advance-time", 0, "with --virtual-time, advances the sandbox's virtual time by this duration, e.g. 1s, firing the timers that expire in the meantime in deadline order.")
+	f.BoolVar(&d.advanceToNextTimer, "advance-to-next-timer", false, "with --virtual-time, advances the sandbox's virtual time to the earliest timer deadline.")
+	f.BoolVar(&d.waitIdle, "wait-idle", false, "with --advance-time or --advance-to-next-timer, waits for all tasks to block before advancing time, and again before returning.")
+	f.DurationVar(&d.idleTimeout, "idle-timeout", 10*time.Second, "with --wait-idle, the maximum time to wait for the sandbox to be idle. 0 waits forever.")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -156,7 +192,7 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		}
 		util.Infof("     *** Stack dump ***\n%s", stacks)
 	}
-	if d.strace != "" || len(d.logLevel) != 0 || len(d.logPackets) != 0 {
+	if d.strace != "" || len(d.logLevel) != 0 || len(d.logPackets) != 0 || len(d.logSubsystems) != 0 {
 		args := control.LoggingArgs{}
 		switch strings.ToLower(d.strace) {
 		case "":
@@ -193,6 +229,14 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 			util.Infof("Setting log level %v", args.Level)
 		}
 
+		if len(d.logSubsystems) != 0 {
+			args.SetSubsystems = true
+			if strings.ToLower(d.logSubsystems) != "all" {
+				args.Subsystems = strings.Split(d.logSubsystems, ",")
+			}
+			util.Infof("Setting log subsystems %q", d.logSubsystems)
+		}
+
 		if len(d.logPackets) != 0 {
 			args.SetLogPackets = true
 			lp, err := strconv.ParseBool(d.logPackets)
@@ -224,6 +268,105 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		}
 		util.Infof("%s", o)
 	}
+	if d.network {
+		stats, err := c.Sandbox.NetworkStats()
+		if err != nil {
+			return util.Errorf("retrieving network stats: %v", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			return util.Errorf("encoding network stats: %v", err)
+		}
+	}
+	if d.conntrack {
+		out, err := c.Sandbox.ConnTrack()
+		if err != nil {
+			return util.Errorf("retrieving conntrack table: %v", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return util.Errorf("encoding conntrack table: %v", err)
+		}
+	}
+	if d.compatReport {
+		report, err := c.Sandbox.CompatReport()
+		if err != nil {
+			return util.Errorf("retrieving compat report: %v", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return util.Errorf("encoding compat report: %v", err)
+		}
+	}
+	if d.memory {
+		breakdown, err := c.Sandbox.MemoryBreakdown()
+		if err != nil {
+			return util.Errorf("retrieving memory breakdown: %v", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(breakdown); err != nil {
+			return util.Errorf("encoding memory breakdown: %v", err)
+		}
+	}
+	if d.metrics {
+		metrics, err := c.Sandbox.ExportMetrics()
+		if err != nil {
+			return util.Errorf("retrieving metrics: %v", err)
+		}
+		os.Stdout.WriteString(metrics)
+	}
+	if d.fds {
+		if err := c.Sandbox.FDsDump(os.Stdout); err != nil {
+			return util.Errorf("dumping FDs: %v", err)
+		}
+	}
+	if d.realtimeOffset != "" {
+		offset, err := time.ParseDuration(d.realtimeOffset)
+		if err != nil {
+			return util.Errorf("invalid realtime offset %q: %v", d.realtimeOffset, err)
+		}
+		if err := c.Sandbox.SetRealtimeOffset(offset); err != nil {
+			return util.Errorf("setting realtime offset: %v", err)
+		}
+		log.Infof("Realtime offset set to %v", offset)
+	}
+	if d.advanceTime != 0 || d.advanceToNextTimer {
+		if d.advanceTime < 0 {
+			return util.Errorf("invalid time advance %v: must be positive", d.advanceTime)
+		}
+		if d.advanceTime != 0 && d.advanceToNextTimer {
+			return util.Errorf("--advance-time and --advance-to-next-timer are mutually exclusive")
+		}
+		now, err := c.Sandbox.AdvanceTime(&boot.AdvanceTimeArgs{
+			Delta:       d.advanceTime,
+			NextTimer:   d.advanceToNextTimer,
+			WaitIdle:    d.waitIdle,
+			IdleTimeout: d.idleTimeout,
+		})
+		if err != nil {
+			return util.Errorf("advancing time: %v", err)
+		}
+		fmt.Printf("%v\n", now)
+		log.Infof("Virtual time advanced, CLOCK_MONOTONIC is now %v", now)
+	}
+	if d.dumpLogs {
+		if err := c.Sandbox.DumpLogs(os.Stdout); err != nil {
+			return util.Errorf("dumping logs: %v", err)
+		}
+	}
+	if d.followLogs {
+		if d.profileBlock != "" || d.profileCPU != "" || d.profileHeap != "" || d.profileMutex != "" || d.trace != "" {
+			return util.Errorf("--follow-logs can't be combined with profiling flags")
+		}
+		if err := followLogs(c); err != nil {
+			return util.Errorf("following logs: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
 
 	// Open profiling files.
 	var (
@@ -286,7 +429,7 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			blockErr = c.Sandbox.BlockProfile(blockFile, d.duration)
+			blockErr = c.Sandbox.BlockProfile(blockFile, d.duration, d.profileBlockRate)
 		}()
 	}
 	if cpuFile != nil {
@@ -307,7 +450,7 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			mutexErr = c.Sandbox.MutexProfile(mutexFile, d.duration)
+			mutexErr = c.Sandbox.MutexProfile(mutexFile, d.duration, d.profileMutexFraction)
 		}()
 	}
 	if traceFile != nil {
@@ -379,3 +522,24 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 
 	return subcommands.ExitSuccess
 }
+
+// followLogs copies log statements from the sandbox to stdout until
+// interrupted. The sandbox writes to a pipe, rather than to stdout directly,
+// so that it stops once this process exits and the read end is closed.
+func followLogs(c *container.Container) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Sandbox.FollowLogs(w)
+		w.Close()
+	}()
+	if _, err := io.Copy(os.Stdout, r); err != nil {
+		return err
+	}
+	return <-errCh
+}
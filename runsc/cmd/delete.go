@@ -25,6 +25,7 @@ import (
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/lib"
 )
 
 // Delete implements subcommands.Command for the "delete" command.
@@ -69,7 +70,7 @@ func (d *Delete) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}
 
 func (d *Delete) execute(ids []string, conf *config.Config) error {
 	for _, id := range ids {
-		c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+		c, err := lib.Load(conf, id)
 		if err != nil {
 			if os.IsNotExist(err) && d.force {
 				log.Warningf("couldn't find container %q: %v", id, err)
@@ -77,7 +78,7 @@ func (d *Delete) execute(ids []string, conf *config.Config) error {
 			}
 			return fmt.Errorf("loading container %q: %v", id, err)
 		}
-		if !d.force && c.Status != container.Created && c.Status != container.Stopped {
+		if !d.force && c.Status() != container.Created && c.Status() != container.Stopped {
 			return fmt.Errorf("cannot delete container that is not stopped without --force flag")
 		}
 		if err := c.Destroy(); err != nil {
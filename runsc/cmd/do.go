@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -50,6 +51,8 @@ type Do struct {
 	overlay bool
 	uidMap  idMapSlice
 	gidMap  idMapSlice
+	volumes volumeSlice
+	ports   portSlice
 }
 
 // Name implements subcommands.Command.Name.
@@ -71,6 +74,11 @@ with a writable tmpfs overlay on top of it. The given command is executed inside
 the sandbox. It's to be used to quickly test applications without having to
 install or run docker. It doesn't give nearly as many options and it's to be
 used for testing only.
+
+Host directories can be mounted inside the sandbox with -v, and ports can be
+published on the host with -p, using the same format as "docker run".
+Published ports are forwarded to the sandbox with iptables DNAT rules, so they
+require the sandbox network.
 `
 }
 
@@ -112,6 +120,126 @@ func (is *idMapSlice) Set(s string) error {
 	return nil
 }
 
+// volume is a host directory mounted inside the sandbox.
+type volume struct {
+	source      string
+	destination string
+	readOnly    bool
+}
+
+type volumeSlice []volume
+
+// String implements flag.Value.String.
+func (vs *volumeSlice) String() string {
+	return fmt.Sprintf("%#v", vs)
+}
+
+// Get implements flag.Value.Get.
+func (vs *volumeSlice) Get() interface{} {
+	return vs
+}
+
+// Set implements flag.Value.Set. Volumes are of the form
+// "host:container[:ro|:rw]".
+func (vs *volumeSlice) Set(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return fmt.Errorf("invalid volume %q, must be of the form host:container[:ro|:rw]", s)
+	}
+	v := volume{source: parts[0], destination: parts[1]}
+	if !filepath.IsAbs(v.destination) {
+		return fmt.Errorf("invalid volume %q, container path must be absolute", s)
+	}
+	v.destination = filepath.Clean(v.destination)
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+			v.readOnly = true
+		case "rw":
+		default:
+			return fmt.Errorf("invalid volume %q, mode must be ro or rw", s)
+		}
+	}
+	for _, other := range *vs {
+		if other.destination == v.destination {
+			return fmt.Errorf("invalid volume %q, %q is already mounted", s, v.destination)
+		}
+	}
+	*vs = append(*vs, v)
+	return nil
+}
+
+// portMapping is a host port published to a port in the sandbox.
+type portMapping struct {
+	hostPort      uint16
+	containerPort uint16
+	proto         string
+}
+
+type portSlice []portMapping
+
+// String implements flag.Value.String.
+func (ps *portSlice) String() string {
+	return fmt.Sprintf("%#v", ps)
+}
+
+// Get implements flag.Value.Get.
+func (ps *portSlice) Get() interface{} {
+	return ps
+}
+
+// Set implements flag.Value.Set. Ports are of the form
+// "host:container[/tcp|/udp]".
+func (ps *portSlice) Set(s string) error {
+	p := portMapping{proto: "tcp"}
+	ports := s
+	if i := strings.Index(s, "/"); i >= 0 {
+		ports, p.proto = s[:i], s[i+1:]
+		if p.proto != "tcp" && p.proto != "udp" {
+			return fmt.Errorf("invalid port %q, protocol must be tcp or udp", s)
+		}
+	}
+	parts := strings.Split(ports, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid port %q, must be of the form host:container[/tcp|/udp]", s)
+	}
+	host, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || host == 0 {
+		return fmt.Errorf("invalid host port in %q", s)
+	}
+	container, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil || container == 0 {
+		return fmt.Errorf("invalid container port in %q", s)
+	}
+	p.hostPort = uint16(host)
+	p.containerPort = uint16(container)
+	for _, other := range *ps {
+		if other.hostPort == p.hostPort && other.proto == p.proto {
+			return fmt.Errorf("invalid port %q, host port %d/%s is already published", s, p.hostPort, p.proto)
+		}
+	}
+	*ps = append(*ps, p)
+	return nil
+}
+
+// checkAvailable returns an error if the host port can't be published because
+// it's already in use.
+func (p *portMapping) checkAvailable() error {
+	addr := fmt.Sprintf(":%d", p.hostPort)
+	if p.proto == "udp" {
+		l, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return fmt.Errorf("host port %d/udp is not available: %v", p.hostPort, err)
+		}
+		return l.Close()
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("host port %d/tcp is not available: %v", p.hostPort, err)
+	}
+	return l.Close()
+}
+
 // SetFlags implements subcommands.Command.SetFlags.
 func (c *Do) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.root, "root", "/", `path to the root directory, defaults to "/"`)
@@ -121,6 +249,8 @@ func (c *Do) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&c.overlay, "force-overlay", true, "use an overlay. WARNING: disabling gives the command write access to the host")
 	f.Var(&c.uidMap, "uid-map", "Add a user id mapping [ContainerID, HostID, Size]")
 	f.Var(&c.gidMap, "gid-map", "Add a group id mapping [ContainerID, HostID, Size]")
+	f.Var(&c.volumes, "v", "Mount a host directory in the sandbox [host:container[:ro|:rw]]. Can be repeated")
+	f.Var(&c.ports, "p", "Publish a sandbox port on the host [host:container[/tcp|/udp]]. Can be repeated")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -169,6 +299,10 @@ func (c *Do) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) su
 		Hostname: hostname,
 	}
 
+	if err := c.addVolumes(spec, conf); err != nil {
+		return util.Errorf("Error setting up volumes: %v", err)
+	}
+
 	cid := fmt.Sprintf("runsc-%06d", rand.Int31n(1000000))
 
 	if c.uidMap != nil || c.gidMap != nil {
@@ -178,8 +312,14 @@ func (c *Do) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) su
 	}
 
 	if conf.Network == config.NetworkNone {
+		if len(c.ports) > 0 {
+			return util.Errorf("Error publishing ports: ports can't be published with --network=none")
+		}
 		addNamespace(spec, specs.LinuxNamespace{Type: specs.NetworkNamespace})
 	} else if conf.Rootless {
+		if len(c.ports) > 0 {
+			return util.Errorf("Error publishing ports: ports can't be published with --rootless")
+		}
 		if conf.Network == config.NetworkSandbox {
 			c.notifyUser("*** Warning: sandbox network isn't supported with --rootless, switching to host ***")
 			conf.Network = config.NetworkHost
@@ -188,6 +328,9 @@ func (c *Do) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) su
 	} else {
 		switch clean, err := c.setupNet(cid, spec); err {
 		case errNoDefaultInterface:
+			if len(c.ports) > 0 {
+				return util.Errorf("Error publishing ports: network interface not found")
+			}
 			log.Warningf("Network interface not found, using internal network")
 			addNamespace(spec, specs.LinuxNamespace{Type: specs.NetworkNamespace})
 			conf.Network = config.NetworkHost
@@ -204,6 +347,38 @@ func (c *Do) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) su
 	return startContainerAndWait(spec, conf, cid, waitStatus)
 }
 
+// addVolumes adds bind mounts for c.volumes to spec. If the root filesystem is
+// wrapped in an overlay, writable volumes are left out of it so that writes
+// reach the host.
+func (c *Do) addVolumes(spec *specs.Spec, conf *config.Config) error {
+	writable := false
+	for _, v := range c.volumes {
+		src, err := resolvePath(v.source)
+		if err != nil {
+			return err
+		}
+		opts := []string{"rbind"}
+		if v.readOnly {
+			opts = append(opts, "ro")
+		} else {
+			writable = true
+		}
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Source:      src,
+			Destination: v.destination,
+			Type:        "bind",
+			Options:     opts,
+		})
+	}
+	if writable && conf.Overlay && !conf.Overlay2.Enabled() {
+		conf.Overlay = false
+		if err := conf.Overlay2.Set("root:memory"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func addNamespace(spec *specs.Spec, ns specs.LinuxNamespace) {
 	if spec.Linux == nil {
 		spec.Linux = &specs.Linux{}
@@ -267,6 +442,17 @@ func (c *Do) setupNet(cid string, spec *specs.Spec) (func(), error) {
 		fmt.Sprintf("iptables -A FORWARD -i %s -o %s -j ACCEPT", dev, peer),
 		fmt.Sprintf("iptables -A FORWARD -o %s -i %s -j ACCEPT", dev, peer),
 	}
+	if len(c.ports) > 0 {
+		// Allow connections from the host to published ports on
+		// localhost to be routed to the sandbox.
+		cmds = append(cmds, fmt.Sprintf("sysctl -w net.ipv4.conf.%s.route_localnet=1", peer))
+	}
+	for _, p := range c.ports {
+		if err := p.checkAvailable(); err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c.portRules("-A", peer, p)...)
+	}
 
 	for _, cmd := range cmds {
 		log.Debugf("Run %q", cmd)
@@ -321,6 +507,9 @@ func (c *Do) cleanupNet(cid, dev, resolvPath, hostnamePath, hostsPath string) {
 		fmt.Sprintf("iptables -D FORWARD -i %s -o %s -j ACCEPT", dev, peer),
 		fmt.Sprintf("iptables -D FORWARD -o %s -i %s -j ACCEPT", dev, peer),
 	}
+	for _, p := range c.ports {
+		cmds = append(cmds, c.portRules("-D", peer, p)...)
+	}
 
 	for _, cmd := range cmds {
 		log.Debugf("Run %q", cmd)
@@ -336,6 +525,21 @@ func (c *Do) cleanupNet(cid, dev, resolvPath, hostnamePath, hostsPath string) {
 	tryRemove(hostsPath)
 }
 
+// portRules returns the iptables commands that add (op is "-A") or delete (op
+// is "-D") the rules forwarding the host port of p to the sandbox. Connections
+// from other hosts go through PREROUTING, and connections from the host itself
+// through OUTPUT.
+func (c *Do) portRules(op, peer string, p portMapping) []string {
+	dnat := fmt.Sprintf("-p %s -m addrtype --dst-type LOCAL --dport %d -m comment --comment runsc-%s -j DNAT --to-destination %s:%d", p.proto, p.hostPort, peer, c.ip, p.containerPort)
+	return []string{
+		fmt.Sprintf("iptables -t nat %s PREROUTING %s", op, dnat),
+		fmt.Sprintf("iptables -t nat %s OUTPUT %s", op, dnat),
+		// Connections from the host itself to a local address have a
+		// local source address, which the sandbox can't reply to.
+		fmt.Sprintf("iptables -t nat %s POSTROUTING -o %s -p %s -d %s --dport %d -m comment --comment runsc-%s -j MASQUERADE", op, peer, p.proto, c.ip, p.containerPort, peer),
+	}
+}
+
 func deviceNames(cid string) (string, string) {
 	// Device name is limited to 15 letters.
 	return "ve-" + cid, "vp-" + cid
@@ -0,0 +1,67 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVolumeFlag(t *testing.T) {
+	var vs volumeSlice
+	for _, v := range []string{"/src:/dst", "rel:/dst2/:ro", "/src:/dst3:rw"} {
+		if err := vs.Set(v); err != nil {
+			t.Fatalf("Set(%q) failed: %v", v, err)
+		}
+	}
+	want := volumeSlice{
+		{source: "/src", destination: "/dst"},
+		{source: "rel", destination: "/dst2", readOnly: true},
+		{source: "/src", destination: "/dst3"},
+	}
+	if !reflect.DeepEqual(vs, want) {
+		t.Errorf("volumes = %+v, want %+v", vs, want)
+	}
+
+	for _, v := range []string{"", "/src", ":/dst", "/src:dst", "/src:/dst4:rx", "/a:/b:ro:x", "/other:/dst"} {
+		if err := vs.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded, want error", v)
+		}
+	}
+}
+
+func TestPortFlag(t *testing.T) {
+	var ps portSlice
+	for _, p := range []string{"8080:80", "8080:53/udp", "9090:90/tcp"} {
+		if err := ps.Set(p); err != nil {
+			t.Fatalf("Set(%q) failed: %v", p, err)
+		}
+	}
+	want := portSlice{
+		{hostPort: 8080, containerPort: 80, proto: "tcp"},
+		{hostPort: 8080, containerPort: 53, proto: "udp"},
+		{hostPort: 9090, containerPort: 90, proto: "tcp"},
+	}
+	if !reflect.DeepEqual(ps, want) {
+		t.Errorf("ports = %+v, want %+v", ps, want)
+	}
+
+	// 8080/tcp conflicts with the port published above.
+	for _, p := range []string{"", "80", "0:80", "80:0", "70000:80", "a:80", "81:80/sctp", "8080:81"} {
+		if err := ps.Set(p); err == nil {
+			t.Errorf("Set(%q) succeeded, want error", p)
+		}
+	}
+}
@@ -17,15 +17,18 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"time"
 
 	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/cmd/util"
 	"gvisor.dev/gvisor/runsc/config"
-	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/lib"
 )
 
 // Events implements subcommands.Command for the "events" command.
@@ -34,6 +37,9 @@ type Events struct {
 	intervalSec int
 	// If true, events will print a single group of stats and exit.
 	stats bool
+	// If true, events will keep a single connection to the sandbox open and
+	// write one JSON event per line until the container stops.
+	stream bool
 }
 
 // Name implements subcommands.Command.Name.
@@ -55,6 +61,10 @@ Where "<container-id>" is the name for the instance of the container.
 The events command displays information about the container. By default the
 information is displayed once every 5 seconds.
 
+With --stream, a single connection to the sandbox is kept open and events are
+written as newline-delimited JSON until the container stops. Container status
+changes, e.g. pause and resume, are reported as events of type "state".
+
 OPTIONS:
 `
 }
@@ -63,6 +73,7 @@ OPTIONS:
 func (evs *Events) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&evs.intervalSec, "interval", 5, "set the stats collection interval, in seconds")
 	f.BoolVar(&evs.stats, "stats", false, "display the container's stats then exit")
+	f.BoolVar(&evs.stream, "stream", false, "stream events as newline-delimited JSON over a single sandbox connection until the container stops")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -75,11 +86,18 @@ func (evs *Events) Execute(_ context.Context, f *flag.FlagSet, args ...interface
 	id := f.Arg(0)
 	conf := args[0].(*config.Config)
 
-	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	c, err := lib.Load(conf, id)
 	if err != nil {
 		util.Fatalf("loading sandbox: %v", err)
 	}
 
+	if evs.stream {
+		if evs.stats {
+			util.Fatalf("--stream and --stats are mutually exclusive")
+		}
+		return evs.streamEvents(c)
+	}
+
 	// Repeatedly get stats from the container. Sleep a bit after every loop
 	// except the first one.
 	for dur := time.Duration(evs.intervalSec) * time.Second; true; time.Sleep(dur) {
@@ -109,3 +127,20 @@ func (evs *Events) Execute(_ context.Context, f *flag.FlagSet, args ...interface
 	}
 	panic("should never get here")
 }
+
+func (evs *Events) streamEvents(c *lib.Container) subcommands.ExitStatus {
+	enc := json.NewEncoder(os.Stdout)
+	err := c.Events(time.Duration(evs.intervalSec)*time.Second, func(ev *boot.Event) error {
+		log.Debugf("Events: %+v", ev)
+		return enc.Encode(ev)
+	})
+	if err != nil {
+		if errors.Is(err, unix.EPIPE) {
+			// The reader went away, nothing else to do.
+			return subcommands.ExitSuccess
+		}
+		log.Warningf("Error streaming events for container: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
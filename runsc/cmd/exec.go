@@ -29,9 +29,11 @@ import (
 	"github.com/google/subcommands"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sighandling"
 	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/cmd/util"
 	"gvisor.dev/gvisor/runsc/config"
@@ -53,11 +55,21 @@ type Exec struct {
 	processPath     string
 	pidFile         string
 	internalPidFile string
+	cpus            float64
+	memoryLimit     uint64
 
 	// consoleSocket is the path to an AF_UNIX socket which will receive a
 	// file descriptor referencing the master end of the console's
 	// pseudoterminal.
 	consoleSocket string
+
+	// tty indicates that the process should be attached to a new
+	// pseudoterminal, which is proxied to the terminal of this process.
+	tty bool
+
+	// detachKeys is the key sequence that detaches from the process when
+	// tty is set.
+	detachKeys string
 }
 
 // Name implements subcommands.Command.Name.
@@ -101,6 +113,10 @@ func (ex *Exec) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&ex.pidFile, "pid-file", "", "filename that the container pid will be written to")
 	f.StringVar(&ex.internalPidFile, "internal-pid-file", "", "filename that the container-internal pid will be written to")
 	f.StringVar(&ex.consoleSocket, "console-socket", "", "path to an AF_UNIX socket which will receive a file descriptor referencing the master end of the console's pseudoterminal")
+	f.BoolVar(&ex.tty, "tty", false, "allocate a pseudoterminal for the process and attach it to the terminal of this process")
+	f.StringVar(&ex.detachKeys, "detach-keys", console.DefaultDetachKeys, "with --tty, key sequence that detaches from the process, leaving it running (e.g. 'ctrl-p,ctrl-q'; empty disables detaching)")
+	f.Float64Var(&ex.cpus, "cpus", 0, "number of CPUs the process and its descendants may use, in addition to the container's limits (0 means no additional limit)")
+	f.Uint64Var(&ex.memoryLimit, "memory-limit", 0, "maximum combined resident set size in bytes of the process and its descendants, which are killed if it is exceeded (0 means no additional limit)")
 }
 
 // Execute implements subcommands.Command.Execute. It starts a process in an
@@ -113,6 +129,12 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	}
 	waitStatus := args[1].(*unix.WaitStatus)
 
+	if ex.cpus < 0 {
+		util.Fatalf("--cpus must not be negative: %v", ex.cpus)
+	}
+	e.CPUs = ex.cpus
+	e.MemoryLimit = ex.memoryLimit
+
 	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
 	if err != nil {
 		util.Fatalf("loading sandbox: %v", err)
@@ -145,8 +167,14 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	// write the child's PID to the pid file. So when the container returns, the
 	// child process will also return and signal containerd.
 	if ex.detach {
+		if ex.tty {
+			util.Fatalf("--tty and --detach are mutually exclusive")
+		}
 		return ex.execChildAndWait(waitStatus)
 	}
+	if ex.tty {
+		return ex.execWithTTY(conf, c, e, waitStatus)
+	}
 	return ex.exec(conf, c, e, waitStatus)
 }
 
@@ -164,11 +192,109 @@ func (ex *Exec) exec(conf *config.Config, c *container.Container, e *control.Exe
 		defer stopForwarding()
 	}
 
-	// Write the sandbox-internal pid if required.
+	if err := ex.writePIDFiles(pid); err != nil {
+		return util.Errorf("%v", err)
+	}
+
+	// Wait for the process to exit.
+	ws, err := c.WaitPID(pid)
+	if err != nil {
+		return util.Errorf("waiting on pid %d: %v", pid, err)
+	}
+	*waitStatus = ws
+	return subcommands.ExitSuccess
+}
+
+// execWithTTY starts the process with a new pty as its stdio, and proxies the
+// pty to the terminal of this process until the process exits or the user
+// types the detach key sequence.
+func (ex *Exec) execWithTTY(conf *config.Config, c *container.Container, e *control.ExecArgs, waitStatus *unix.WaitStatus) subcommands.ExitStatus {
+	if ex.consoleSocket != "" {
+		util.Fatalf("--tty and --console-socket are mutually exclusive")
+	}
+	detachKeys, err := console.ParseDetachKeys(ex.detachKeys)
+	if err != nil {
+		util.Fatalf("parsing --detach-keys: %v", err)
+	}
+	proxy, tty, err := console.NewProxy(detachKeys)
+	if err != nil {
+		util.Fatalf("setting up terminal: %v", err)
+	}
+	e.StdioIsPty = true
+	e.FilePayload = urpc.FilePayload{Files: []*os.File{tty, tty, tty}}
+
+	pid, err := c.Execute(conf, e)
+	tty.Close()
+	if err != nil {
+		proxy.Close()
+		return util.Errorf("executing processes for container: %v", err)
+	}
+
+	// The pty is not the controlling terminal of any host process, so
+	// resizes must be sent to the sandbox explicitly.
+	stopForwarding := sighandling.StartSignalForwarding(func(sig linux.Signal) {
+		if sig == linux.SIGWINCH {
+			ws, err := proxy.Resize()
+			if err == nil {
+				err = c.ResizeTTY(pid, linux.Winsize{Row: ws.Row, Col: ws.Col, Xpixel: ws.Xpixel, Ypixel: ws.Ypixel})
+			}
+			if err != nil {
+				log.Warningf("error resizing terminal of PID %d in container %q: %v", pid, c.ID, err)
+			}
+			return
+		}
+		if err := c.Sandbox.SignalProcess(c.ID, pid, unix.Signal(sig), true /* fgProcess */); err != nil {
+			log.Warningf("error forwarding signal %d to container %q: %v", sig, c.ID, err)
+		}
+	})
+	defer stopForwarding()
+
+	if err := proxy.Start(); err != nil {
+		proxy.Close()
+		return util.Errorf("attaching to terminal: %v", err)
+	}
+
+	if err := ex.writePIDFiles(pid); err != nil {
+		proxy.Close()
+		return util.Errorf("%v", err)
+	}
+
+	// Wait for the process to exit or for the user to detach.
+	type waitResult struct {
+		ws  unix.WaitStatus
+		err error
+	}
+	waited := make(chan waitResult, 1)
+	go func() {
+		ws, err := c.WaitPID(pid)
+		waited <- waitResult{ws, err}
+	}()
+	select {
+	case <-proxy.Detached():
+		if err := proxy.Close(); err != nil {
+			log.Warningf("%v", err)
+		}
+		*waitStatus = 0
+		return subcommands.ExitSuccess
+	case res := <-waited:
+		if err := proxy.Close(); err != nil {
+			log.Warningf("%v", err)
+		}
+		if res.err != nil {
+			return util.Errorf("waiting on pid %d: %v", pid, res.err)
+		}
+		*waitStatus = res.ws
+		return subcommands.ExitSuccess
+	}
+}
+
+// writePIDFiles writes the sandbox-internal pid of the process and the pid of
+// this process, if requested.
+func (ex *Exec) writePIDFiles(pid int32) error {
 	if ex.internalPidFile != "" {
 		pidStr := []byte(strconv.Itoa(int(pid)))
 		if err := ioutil.WriteFile(ex.internalPidFile, pidStr, 0644); err != nil {
-			return util.Errorf("writing internal pid file %q: %v", ex.internalPidFile, err)
+			return fmt.Errorf("writing internal pid file %q: %v", ex.internalPidFile, err)
 		}
 	}
 
@@ -177,17 +303,10 @@ func (ex *Exec) exec(conf *config.Config, c *container.Container, e *control.Exe
 	// `runsc exec -d` returns.
 	if ex.pidFile != "" {
 		if err := ioutil.WriteFile(ex.pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
-			return util.Errorf("writing pid file: %v", err)
+			return fmt.Errorf("writing pid file: %v", err)
 		}
 	}
-
-	// Wait for the process to exit.
-	ws, err := c.WaitPID(pid)
-	if err != nil {
-		return util.Errorf("waiting on pid %d: %v", pid, err)
-	}
-	*waitStatus = ws
-	return subcommands.ExitSuccess
+	return nil
 }
 
 func (ex *Exec) execChildAndWait(waitStatus *unix.WaitStatus) subcommands.ExitStatus {
@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
 
 	"github.com/google/subcommands"
@@ -66,9 +67,10 @@ type Gofer struct {
 	applyCaps bool
 	setUpRoot bool
 
-	specFD       int
-	mountsFD     int
-	syncUsernsFD int
+	specFD         int
+	mountsFD       int
+	syncUsernsFD   int
+	overlayUpperFD int
 
 	profileFDs    profile.FDArgs
 	stopProfiling func()
@@ -96,10 +98,11 @@ func (g *Gofer) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&g.setUpRoot, "setup-root", true, "if true, set up an empty root for the process")
 
 	// Open FDs that are donated to the gofer.
-	f.Var(&g.ioFDs, "io-fds", "list of FDs to connect gofer servers. They must follow this order: root first, then mounts as defined in the spec")
+	f.Var(&g.ioFDs, "io-fds", "list of FDs to connect gofer servers. They must follow this order: root first, then the root overlay's upper layer if --overlay-upper-fd is set, then mounts as defined in the spec")
 	f.IntVar(&g.specFD, "spec-fd", -1, "required fd with the container spec")
 	f.IntVar(&g.mountsFD, "mounts-fd", -1, "mountsFD is the file descriptor to write list of mounts after they have been resolved (direct paths, no symlinks).")
 	f.IntVar(&g.syncUsernsFD, "sync-userns-fd", -1, "file descriptor used to synchronize rootless user namespace initialization.")
+	f.IntVar(&g.overlayUpperFD, "overlay-upper-fd", -1, "file descriptor of the host directory that stores the upper layer of the root overlay. If set, the upper layer is served on the IO FD following the root's.")
 
 	// Profiling flags.
 	g.profileFDs.SetFromFlags(f)
@@ -227,9 +230,11 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 
 	// Initialize filters.
 	opts := filter.Options{
-		UDSOpenEnabled:   conf.GetHostUDS().AllowOpen(),
-		UDSCreateEnabled: conf.GetHostUDS().AllowCreate(),
-		ProfileEnabled:   len(profileOpts) > 0,
+		UDSOpenEnabled:      conf.GetHostUDS().AllowOpen(),
+		UDSCreateEnabled:    conf.GetHostUDS().AllowCreate(),
+		ProfileEnabled:      len(profileOpts) > 0,
+		OverlayUpperEnabled: g.overlayUpperFD >= 0,
+		XattrsEnabled:       conf.GoferXattrs,
 	}
 	if err := filter.Install(opts); err != nil {
 		util.Fatalf("installing seccomp filters: %v", err)
@@ -261,17 +266,39 @@ func (g *Gofer) serveLisafs(spec *specs.Spec, conf *config.Config, root string)
 		// a per connection basis.
 		HostUDS:  conf.GetHostUDS(),
 		HostFifo: conf.HostFifo,
+		DirectFS: conf.DirectFS,
+		Xattrs:   conf.GoferXattrs,
 	})
 
 	// Start with root mount, then add any other additional mount as needed.
 	cfgs = append(cfgs, connectionConfig{
 		sock:      newSocket(g.ioFDs[0]),
 		mountPath: "/", // fsgofer process is always chroot()ed. So serve root.
-		readonly:  spec.Root.Readonly || conf.Overlay,
+		readonly:  spec.Root.Readonly || conf.GetOverlay2().RootMount,
 	})
 	log.Infof("Serving %q mapped to %q on FD %d (ro: %t)", "/", root, g.ioFDs[0], cfgs[0].readonly)
 
 	mountIdx := 1 // first one is the root
+	var upperServer *fsgofer.LisafsServer
+	if g.overlayUpperFD >= 0 {
+		if mountIdx >= len(g.ioFDs) {
+			util.Fatalf("no FD found for the overlay upper layer. FDs: %d", len(g.ioFDs))
+		}
+		// The upper layer is served by its own server, since it is the only
+		// mount that allows overlay whiteouts and overlay extended attributes.
+		upperServer = fsgofer.NewLisafsServer(fsgofer.Config{
+			OverlayUpper: true,
+			Xattrs:       conf.GoferXattrs,
+			MountFD:      g.overlayUpperFD,
+		})
+		conn, err := upperServer.CreateConnection(newSocket(g.ioFDs[mountIdx]), "/", false /* readonly */)
+		if err != nil {
+			util.Fatalf("starting connection on FD %d for overlay upper layer failed: %v", g.ioFDs[mountIdx], err)
+		}
+		upperServer.StartConnection(conn)
+		log.Infof("Serving overlay upper layer on FD %d", g.ioFDs[mountIdx])
+		mountIdx++
+	}
 	for _, m := range spec.Mounts {
 		if !specutils.IsGoferMount(m) {
 			continue
@@ -287,17 +314,16 @@ func (g *Gofer) serveLisafs(spec *specs.Spec, conf *config.Config, root string)
 		cfgs = append(cfgs, connectionConfig{
 			sock:      newSocket(g.ioFDs[mountIdx]),
 			mountPath: m.Destination,
-			readonly:  isReadonlyMount(m.Options) || conf.Overlay,
+			readonly:  isReadonlyMount(m.Options) || conf.GetOverlay2().SubMounts || isHostProcSysMount(conf, m),
 		})
 
-		log.Infof("Serving %q mapped on FD %d (ro: %t)", m.Destination, g.ioFDs[mountIdx], cfgs[mountIdx].readonly)
+		log.Infof("Serving %q mapped on FD %d (ro: %t)", m.Destination, g.ioFDs[mountIdx], cfgs[len(cfgs)-1].readonly)
 		mountIdx++
 	}
 
 	if mountIdx != len(g.ioFDs) {
 		util.Fatalf("too many FDs passed for mounts. mounts: %d, FDs: %d", mountIdx, len(g.ioFDs))
 	}
-	cfgs = cfgs[:mountIdx]
 
 	for _, cfg := range cfgs {
 		conn, err := server.CreateConnection(cfg.sock, cfg.mountPath, cfg.readonly)
@@ -308,6 +334,10 @@ func (g *Gofer) serveLisafs(spec *specs.Spec, conf *config.Config, root string)
 	}
 	server.Wait()
 	server.Destroy()
+	if upperServer != nil {
+		upperServer.Wait()
+		upperServer.Destroy()
+	}
 	log.Infof("All lisafs servers exited.")
 	if g.stopProfiling != nil {
 		g.stopProfiling()
@@ -316,10 +346,14 @@ func (g *Gofer) serveLisafs(spec *specs.Spec, conf *config.Config, root string)
 }
 
 func (g *Gofer) serve9P(spec *specs.Spec, conf *config.Config, root string) subcommands.ExitStatus {
+	if g.overlayUpperFD >= 0 {
+		util.Fatalf("serving the overlay upper layer requires lisafs")
+	}
+
 	// Start with root mount, then add any other additional mount as needed.
 	ats := make([]p9.Attacher, 0, len(spec.Mounts)+1)
 	ap, err := fsgofer.NewAttachPoint("/", fsgofer.Config{
-		ROMount:  spec.Root.Readonly || conf.Overlay,
+		ROMount:  spec.Root.Readonly || conf.GetOverlay2().RootMount,
 		HostUDS:  conf.GetHostUDS(),
 		HostFifo: conf.HostFifo,
 	})
@@ -333,7 +367,7 @@ func (g *Gofer) serve9P(spec *specs.Spec, conf *config.Config, root string) subc
 	for _, m := range spec.Mounts {
 		if specutils.IsGoferMount(m) {
 			cfg := fsgofer.Config{
-				ROMount:  isReadonlyMount(m.Options) || conf.Overlay,
+				ROMount:  isReadonlyMount(m.Options) || conf.GetOverlay2().SubMounts || isHostProcSysMount(conf, m),
 				HostUDS:  conf.GetHostUDS(),
 				HostFifo: conf.HostFifo,
 			}
@@ -406,6 +440,12 @@ func isReadonlyMount(opts []string) bool {
 	return false
 }
 
+// isHostProcSysMount returns true if m is a passthrough mount of the host's
+// /proc or /sys, which is always served read-only.
+func isHostProcSysMount(conf *config.Config, m specs.Mount) bool {
+	return conf.HostProcSysMounts && specutils.IsHostProcSysMount(m)
+}
+
 func setupRootFS(spec *specs.Spec, conf *config.Config) error {
 	// Convert all shared mounts into slaves to be sure that nothing will be
 	// propagated outside of our namespace.
@@ -414,6 +454,18 @@ func setupRootFS(spec *specs.Spec, conf *config.Config) error {
 		util.Fatalf("error converting mounts: %v", err)
 	}
 
+	// The host's /proc is hidden below, so open the sources of passthrough
+	// mounts while they can still be reached.
+	hostFDs, err := openHostProcSysMounts(conf, spec.Mounts)
+	if err != nil {
+		util.Fatalf("error opening host /proc and /sys mounts: %v", err)
+	}
+	defer func() {
+		for _, fd := range hostFDs {
+			_ = unix.Close(fd)
+		}
+	}()
+
 	root := spec.Root.Path
 	if !conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
 		// runsc can't be re-executed without /proc, so we create a tmpfs mount,
@@ -463,7 +515,7 @@ func setupRootFS(spec *specs.Spec, conf *config.Config) error {
 	}
 
 	// Replace the current spec, with the clean spec with symlinks resolved.
-	if err := setupMounts(conf, spec.Mounts, root, procPath); err != nil {
+	if err := setupMounts(conf, spec.Mounts, root, procPath, hostFDs); err != nil {
 		util.Fatalf("error setting up FS: %v", err)
 	}
 
@@ -480,7 +532,7 @@ func setupRootFS(spec *specs.Spec, conf *config.Config) error {
 	}
 
 	// Check if root needs to be remounted as readonly.
-	if spec.Root.Readonly || conf.Overlay {
+	if spec.Root.Readonly || conf.GetOverlay2().RootMount {
 		// If root is a mount point but not read-only, we can change mount options
 		// to make it read-only for extra safety.
 		log.Infof("Remounting root as readonly: %q", root)
@@ -501,10 +553,34 @@ func setupRootFS(spec *specs.Spec, conf *config.Config) error {
 	return nil
 }
 
+// openHostProcSysMounts opens O_PATH FDs for the sources of host /proc and
+// /sys passthrough mounts, keyed by source.
+func openHostProcSysMounts(conf *config.Config, mounts []specs.Mount) (map[string]int, error) {
+	fds := make(map[string]int)
+	for _, m := range mounts {
+		if !isHostProcSysMount(conf, m) {
+			continue
+		}
+		if _, ok := fds[m.Source]; ok {
+			continue
+		}
+		fd, err := unix.Open(m.Source, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			for _, fd := range fds {
+				_ = unix.Close(fd)
+			}
+			return nil, fmt.Errorf("opening %q: %v", m.Source, err)
+		}
+		fds[m.Source] = fd
+	}
+	return fds, nil
+}
+
 // setupMounts bind mounts all mounts specified in the spec in their correct
 // location inside root. It will resolve relative paths and symlinks. It also
-// creates directories as needed.
-func setupMounts(conf *config.Config, mounts []specs.Mount, root, procPath string) error {
+// creates directories as needed. Sources of host /proc and /sys passthrough
+// mounts are taken from hostFDs, and are mounted read-only.
+func setupMounts(conf *config.Config, mounts []specs.Mount, root, procPath string, hostFDs map[string]int) error {
 	for _, m := range mounts {
 		if !specutils.IsGoferMount(m) {
 			continue
@@ -516,15 +592,30 @@ func setupMounts(conf *config.Config, mounts []specs.Mount, root, procPath strin
 		}
 
 		flags := specutils.OptionsToFlags(m.Options) | unix.MS_BIND
-		if conf.Overlay {
+		if conf.GetOverlay2().SubMounts {
 			// Force mount read-only if writes are not going to be sent to it.
 			flags |= unix.MS_RDONLY
 		}
 
-		log.Infof("Mounting src: %q, dst: %q, flags: %#x", m.Source, dst, flags)
-		if err := specutils.SafeSetupAndMount(m.Source, dst, m.Type, flags, procPath); err != nil {
+		src := m.Source
+		hostFD, passthrough := hostFDs[m.Source]
+		if passthrough {
+			src = filepath.Join(procPath, "self/fd", strconv.Itoa(hostFD))
+			flags |= unix.MS_RDONLY
+		}
+
+		log.Infof("Mounting src: %q, dst: %q, flags: %#x", src, dst, flags)
+		if err := specutils.SafeSetupAndMount(src, dst, m.Type, flags, procPath); err != nil {
 			return fmt.Errorf("mounting %+v: %v", m, err)
 		}
+		if passthrough {
+			// MS_RDONLY is ignored when creating a bind mount, so remount it
+			// read-only as well.
+			roFlags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+			if err := specutils.SafeMount("", dst, "", roFlags, "", procPath); err != nil {
+				return fmt.Errorf("remounting %q read-only: %v", dst, err)
+			}
+		}
 
 		// Set propagation options that cannot be set together with other options.
 		flags = specutils.PropOptionsToFlags(m.Options)
@@ -0,0 +1,83 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// IOMax implements subcommands.Command for the "io-max" command.
+type IOMax struct{}
+
+// Name implements subcommands.Command.Name.
+func (*IOMax) Name() string {
+	return "io-max"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*IOMax) Synopsis() string {
+	return "changes the file I/O limits of a running container"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*IOMax) Usage() string {
+	return `io-max <container id> <limit>...
+
+Changes the limits on file I/O to regular files performed by the given
+container. Limits have the format of cgroup v2 io.max without the device, and
+limits that are not given become unlimited, e.g.:
+
+	runsc io-max <container id> rbps=1048576 wiops=100
+
+The current limits and the time I/O has been throttled for are reported by
+"runsc events". I/O that exceeds the limits is delayed rather than failed.
+The initial limits may be given by the "dev.gvisor.spec.io.max" annotation.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*IOMax) SetFlags(*flag.FlagSet) {}
+
+// Execute implements subcommands.Command.Execute.
+func (*IOMax) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() < 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	limits, err := boot.ParseIOLimits(strings.Join(f.Args()[1:], " "))
+	if err != nil {
+		util.Fatalf("%v", err)
+	}
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if err := c.SetIOLimits(limits); err != nil {
+		util.Fatalf("setting I/O limits: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
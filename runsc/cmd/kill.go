@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/subcommands"
 	"golang.org/x/sys/unix"
@@ -28,10 +29,16 @@ import (
 	"gvisor.dev/gvisor/runsc/flag"
 )
 
+// killForcedExitStatus is the exit status of "runsc kill --all --timeout" when
+// some processes had to be sent SIGKILL. It matches timeout(1) with
+// --kill-after.
+const killForcedExitStatus = 137
+
 // Kill implements subcommands.Command for the "kill" command.
 type Kill struct {
-	all bool
-	pid int
+	all     bool
+	pid     int
+	timeout time.Duration
 }
 
 // Name implements subcommands.Command.Name.
@@ -53,6 +60,7 @@ func (*Kill) Usage() string {
 func (k *Kill) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&k.all, "all", false, "send the specified signal to all processes inside the container")
 	f.IntVar(&k.pid, "pid", 0, "send the specified signal to a specific process. pid is relative to the root PID namespace")
+	f.DurationVar(&k.timeout, "timeout", 0, fmt.Sprintf("with --all, wait up to this long for all processes to exit, then send SIGKILL to any that remain. If SIGKILL had to be sent, runsc exits with status %d", killForcedExitStatus))
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -68,6 +76,12 @@ func (k *Kill) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	if k.pid != 0 && k.all {
 		util.Fatalf("it is invalid to specify both --all and --pid")
 	}
+	if k.timeout != 0 && !k.all {
+		util.Fatalf("--timeout requires --all")
+	}
+	if k.timeout < 0 {
+		util.Fatalf("--timeout must not be negative")
+	}
 
 	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
 	if err != nil {
@@ -91,6 +105,14 @@ func (k *Kill) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		if err := c.SignalProcess(sig, int32(k.pid)); err != nil {
 			util.Fatalf("failed to signal pid %d: %v", k.pid, err)
 		}
+	} else if k.timeout != 0 {
+		forced, err := c.KillAll(sig, k.timeout)
+		if err != nil {
+			util.Fatalf("%v", err)
+		}
+		if forced {
+			return killForcedExitStatus
+		}
 	} else {
 		if err := c.SignalContainer(sig, k.all); err != nil {
 			util.Fatalf("%v", err)
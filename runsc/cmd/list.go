@@ -31,10 +31,47 @@ import (
 	"gvisor.dev/gvisor/runsc/flag"
 )
 
+// listProbeTimeout is how long "list" waits for each sandbox to report its
+// memory usage.
+const listProbeTimeout = time.Second
+
 // List implements subcommands.Command for the "list" command.
 type List struct {
-	quiet  bool
-	format string
+	quiet   bool
+	format  string
+	noProbe bool
+
+	// usage caches the memory usage of probed sandboxes, keyed by sandbox ID.
+	usage map[string]uint64
+}
+
+// containerInfo is the JSON output of "list" for a container. It extends the
+// OCI state of the container with information about its sandbox.
+type containerInfo struct {
+	specs.State
+
+	// SandboxID is the ID of the sandbox that the container runs in.
+	SandboxID string `json:"sandboxId,omitempty"`
+
+	// SandboxPid is the PID of the sandbox process, which may have exited.
+	SandboxPid int `json:"sandboxPid,omitempty"`
+
+	// CgroupPath is the path of the sandbox's cgroup on the host, if any.
+	CgroupPath string `json:"cgroupPath,omitempty"`
+
+	// SandboxContainers is the number of containers in the sandbox.
+	SandboxContainers int `json:"sandboxContainers,omitempty"`
+
+	// SandboxRSS is the total memory usage of the sandbox in bytes. It's
+	// omitted if the sandbox wasn't probed or didn't respond.
+	SandboxRSS uint64 `json:"sandboxRss,omitempty"`
+
+	// StatusChangedAt is the time of the container's last status change.
+	StatusChangedAt time.Time `json:"statusChangedAt"`
+
+	// Stale is true if the container's state file says that it exists, but
+	// its sandbox process has died.
+	Stale bool `json:"stale,omitempty"`
 }
 
 // Name implements subcommands.command.name.
@@ -56,6 +93,7 @@ func (*List) Usage() string {
 func (l *List) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&l.quiet, "quiet", false, "only list container ids")
 	f.StringVar(&l.format, "format", "text", "output format: 'text' (default) or 'json'")
+	f.BoolVar(&l.noProbe, "no-probe", false, "don't query sandboxes for container status and memory usage, e.g. when sandboxes may be unresponsive. Status is reported from the state files only.")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -78,14 +116,20 @@ func (l *List) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		return subcommands.ExitSuccess
 	}
 
-	// Collect the containers.
+	// Collect the containers. Stale containers are detected before their
+	// status is refreshed, which would mark them as stopped.
 	var containers []*container.Container
+	stale := make(map[*container.Container]bool)
 	for _, id := range ids {
-		c, err := container.Load(conf.RootDir, id, container.LoadOpts{Exact: true})
+		c, err := container.Load(conf.RootDir, id, container.LoadOpts{Exact: true, SkipCheck: true})
 		if err != nil {
 			log.Warningf("Skipping container %q: %v", id, err)
 			continue
 		}
+		stale[c] = c.IsStale()
+		if !l.noProbe {
+			c.RefreshStatus()
+		}
 		containers = append(containers, c)
 	}
 
@@ -105,12 +149,11 @@ func (l *List) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		}
 		_ = w.Flush()
 	case "json":
-		// Print just the states.
-		var states []specs.State
+		var infos []containerInfo
 		for _, c := range containers {
-			states = append(states, c.State())
+			infos = append(infos, l.containerInfo(c, containers, stale[c]))
 		}
-		if err := json.NewEncoder(os.Stdout).Encode(states); err != nil {
+		if err := json.NewEncoder(os.Stdout).Encode(infos); err != nil {
 			util.Fatalf("marshaling container state: %v", err)
 		}
 	default:
@@ -118,3 +161,55 @@ func (l *List) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	}
 	return subcommands.ExitSuccess
 }
+
+// containerInfo returns the JSON output for c. containers are all listed
+// containers, and stale is true if c is stale.
+func (l *List) containerInfo(c *container.Container, containers []*container.Container, stale bool) containerInfo {
+	info := containerInfo{
+		State:           c.State(),
+		StatusChangedAt: c.StatusChangedAt,
+		Stale:           stale,
+	}
+	if info.StatusChangedAt.IsZero() {
+		// The container was created by an older version of runsc, which didn't
+		// record status changes.
+		info.StatusChangedAt = c.CreatedAt
+	}
+
+	s := c.Sandbox
+	if s == nil {
+		return info
+	}
+	info.SandboxID = s.ID
+	info.SandboxPid = s.Getpid()
+	if cg := s.CgroupJSON.Cgroup; cg != nil {
+		// With cgroup v1, report the memory controller's path, which accounts
+		// for the sandbox's memory usage. With cgroup v2, the controller is
+		// ignored.
+		info.CgroupPath = cg.MakePath("memory")
+	}
+	for _, other := range containers {
+		if other.Sandbox != nil && other.Sandbox.ID == s.ID {
+			info.SandboxContainers++
+		}
+	}
+
+	if !l.noProbe && !stale && c.IsSandboxRunning() {
+		usage, ok := l.usage[s.ID]
+		if !ok {
+			m, err := s.UsageTimeout(false, listProbeTimeout)
+			if err != nil {
+				log.Warningf("Getting memory usage of sandbox %q: %v", s.ID, err)
+			}
+			usage = m.Total
+			if l.usage == nil {
+				l.usage = make(map[string]uint64)
+			}
+			// Don't probe the sandbox again for other containers, even if it
+			// didn't respond.
+			l.usage[s.ID] = usage
+		}
+		info.SandboxRSS = usage
+	}
+	return info
+}
@@ -0,0 +1,275 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/cleanup"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/state"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/lib"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// Migrate implements subcommands.Command for the "migrate" command.
+type Migrate struct {
+	// Flags used to accept a migration are a super-set of those for Restore.
+	Restore
+
+	// to is the address of the destination to migrate the container to.
+	to string
+
+	// listen is the address to accept a migration on.
+	listen string
+
+	// maxRounds is the maximum number of rounds in which memory is copied
+	// while the container is running.
+	maxRounds int
+
+	// dirtyThreshold ends pre-copy once a round copies at most this many
+	// bytes of memory.
+	dirtyThreshold uint64
+}
+
+// Name implements subcommands.Command.Name.
+func (*Migrate) Name() string {
+	return "migrate"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Migrate) Synopsis() string {
+	return "migrate a running container to another host (experimental)"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Migrate) Usage() string {
+	return `migrate [flags] <container id> - migrate a running container.
+
+On the destination host, accept a migration into a new container created from
+the bundle given by --bundle. The checkpoint image received is saved to the
+directory given by --image-path:
+
+	runsc migrate --listen=:9999 --image-path=/tmp/image --bundle=. <container id>
+
+Then, on the source host:
+
+	runsc migrate --to=dest.example.com:9999 <container id>
+
+Memory is copied to the destination while the container keeps running, until a
+round copies at most --dirty-threshold bytes or --max-rounds rounds have been
+done. The container is then paused, and its state and the memory that changed
+since it was copied are sent. The source sandbox exits once the container has
+been restored at the destination, and resumes running if that fails. As on
+restore, network connections may be reset.
+
+The migration is neither encrypted nor authenticated, so it should only be done
+over a trusted network.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (m *Migrate) SetFlags(f *flag.FlagSet) {
+	m.Restore.SetFlags(f)
+	f.StringVar(&m.to, "to", "", "host:port of the destination to migrate the container to")
+	f.StringVar(&m.listen, "listen", "", "address to accept a migration on, e.g. :9999; incompatible with to")
+	f.IntVar(&m.maxRounds, "max-rounds", 5, "maximum number of rounds in which memory is copied while the container is running")
+	f.Uint64Var(&m.dirtyThreshold, "dirty-threshold", 16<<20, "stop copying memory while the container is running once a round copies at most this many bytes")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (m *Migrate) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+	waitStatus := args[1].(*unix.WaitStatus)
+
+	switch {
+	case m.to != "" && m.listen != "":
+		return util.Errorf("to and listen flags are mutually exclusive")
+	case m.to != "":
+		return m.migrate(conf, id)
+	case m.listen != "":
+		return m.accept(conf, id, waitStatus)
+	default:
+		return util.Errorf("to or listen flag must be provided")
+	}
+}
+
+// migrate migrates the container to m.to.
+func (m *Migrate) migrate(conf *config.Config, id string) subcommands.ExitStatus {
+	cont, err := lib.Load(conf, id)
+	if err != nil {
+		return util.Errorf("loading container: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", m.to)
+	if err != nil {
+		return util.Errorf("connecting to %q: %v", m.to, err)
+	}
+	defer conn.Close()
+	// The sandbox migrates over the connection directly.
+	connFile, err := conn.(*net.TCPConn).File()
+	if err != nil {
+		return util.Errorf("getting connection file: %v", err)
+	}
+	defer connFile.Close()
+
+	stats, err := cont.Migrate(connFile, m.maxRounds, m.dirtyThreshold)
+	if err != nil {
+		return util.Errorf("migration failed: %v", err)
+	}
+	for i, round := range stats.Precopy {
+		fmt.Printf("Pre-copy round %d: %d bytes in %v\n", i+1, round.Bytes, round.Duration)
+	}
+	fmt.Printf("Stop-and-copy: %d bytes in %v\n", stats.StopAndCopyBytes, stats.StopAndCopy)
+	fmt.Printf("Restore: %v\n", stats.Restore)
+	fmt.Printf("Downtime: %v\n", stats.Downtime)
+	return subcommands.ExitSuccess
+}
+
+// accept accepts a migration on m.listen, and restores it into a new
+// container.
+func (m *Migrate) accept(conf *config.Config, id string, waitStatus *unix.WaitStatus) subcommands.ExitStatus {
+	if conf.Rootless {
+		return util.Errorf("Rootless mode not supported with %q", m.Name())
+	}
+	if m.imagePath == "" {
+		return util.Errorf("image-path flag must be provided with listen")
+	}
+	if m.imageFD >= 0 || m.encryptionKeyFD >= 0 {
+		return util.Errorf("image-fd and encryption-key-fd flags can't be used with migrate")
+	}
+
+	bundleDir := m.bundleDir
+	if bundleDir == "" {
+		bundleDir = getwdOrDie()
+	}
+	spec, err := specutils.ReadSpec(bundleDir, conf)
+	if err != nil {
+		return util.Errorf("reading spec: %v", err)
+	}
+	specutils.LogSpec(spec)
+
+	// Files received are only valid in a new image directory, since the
+	// contents of memory are written at arbitrary offsets.
+	if err := os.MkdirAll(m.imagePath, 0755); err != nil {
+		return util.Errorf("making directories at path provided: %v", err)
+	}
+	stateFile, err := os.OpenFile(filepath.Join(m.imagePath, checkpointFileName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return util.Errorf("creating image file: %v", err)
+	}
+	defer stateFile.Close()
+	pagesFile, err := os.OpenFile(filepath.Join(m.imagePath, pagesFileName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return util.Errorf("creating pages file: %v", err)
+	}
+	defer pagesFile.Close()
+
+	l, err := net.Listen("tcp", m.listen)
+	if err != nil {
+		return util.Errorf("listening on %q: %v", m.listen, err)
+	}
+	defer l.Close()
+
+	// Create the container before accepting the migration, so that its
+	// sandbox is ready to restore as soon as the state has been received.
+	cont, err := lib.New(conf, lib.Args{
+		ID:            id,
+		Spec:          spec,
+		BundleDir:     bundleDir,
+		ConsoleSocket: m.consoleSocket,
+		PIDFile:       m.pidFile,
+		UserLog:       m.userLog,
+		Attached:      !m.detach,
+	})
+	if err != nil {
+		return util.Errorf("creating container: %v", err)
+	}
+	cu := cleanup.Make(func() {
+		cont.Destroy()
+	})
+	defer cu.Clean()
+
+	log.Infof("Waiting for migration on %v", l.Addr())
+	conn, err := l.Accept()
+	if err != nil {
+		return util.Errorf("accepting migration: %v", err)
+	}
+	defer conn.Close()
+	if err := state.AcceptMigration(conn); err != nil {
+		return util.Errorf("accepting migration: %v", err)
+	}
+
+	start := time.Now()
+	n, err := state.ReceiveMigration(conn, stateFile, pagesFile)
+	if err != nil {
+		return util.Errorf("receiving migration: %v", err)
+	}
+	log.Infof("Received migration with %d bytes of memory in [%s]", n, time.Since(start))
+
+	start = time.Now()
+	err = m.restoreReceived(conf, cont)
+	d := time.Since(start)
+	if replyErr := state.ReplyMigration(conn, d, err); replyErr != nil && err == nil {
+		// The source can't know that the container was restored, so it
+		// will resume too.
+		err = fmt.Errorf("replying to source: %v", replyErr)
+	}
+	if err != nil {
+		return util.Errorf("restoring container: %v", err)
+	}
+	log.Infof("Restored migrated container in [%s]", d)
+
+	cu.Release()
+	if m.detach {
+		return subcommands.ExitSuccess
+	}
+	ws, err := cont.Wait(0)
+	if err != nil {
+		return util.Errorf("waiting for container: %v", err)
+	}
+	*waitStatus = ws
+	return subcommands.ExitSuccess
+}
+
+// restoreReceived restores cont from the checkpoint image received in
+// m.imagePath.
+func (m *Migrate) restoreReceived(conf *config.Config, cont *lib.Container) error {
+	if err := m.setRestoreFiles(conf, m.imagePath); err != nil {
+		return err
+	}
+	image, err := os.Open(conf.RestoreFile)
+	if err != nil {
+		return fmt.Errorf("opening image file: %v", err)
+	}
+	defer image.Close()
+	return cont.Restore(image)
+}
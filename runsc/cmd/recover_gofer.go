@@ -0,0 +1,76 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// RecoverGofer implements subcommands.Command for the "recover-gofer" command.
+type RecoverGofer struct{}
+
+// Name implements subcommands.Command.Name.
+func (*RecoverGofer) Name() string {
+	return "recover-gofer"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*RecoverGofer) Synopsis() string {
+	return "restarts the gofer of a running container after it died"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*RecoverGofer) Usage() string {
+	return `recover-gofer <container id>
+
+Starts a new gofer for the given container after its gofer process died, and
+reconnects the container's filesystems to it. The sandbox must have been
+started with --gofer-reconnect-timeout, which is how long file operations in
+the container wait for the gofer to be recovered before failing with EINTR.
+
+Files that were opened or looked up before the gofer died are looked up again
+by path. Operations on files that were removed or replaced in the meantime
+fail with ESTALE.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*RecoverGofer) SetFlags(*flag.FlagSet) {}
+
+// Execute implements subcommands.Command.Execute.
+func (*RecoverGofer) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if err := c.RecoverGofer(conf); err != nil {
+		util.Fatalf("recovering gofer: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
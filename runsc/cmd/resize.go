@@ -0,0 +1,82 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// Resize implements subcommands.Command for the "resize" command.
+type Resize struct {
+	cpus   uint
+	memory uint64
+}
+
+// Name implements subcommands.Command.Name.
+func (*Resize) Name() string {
+	return "resize"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Resize) Synopsis() string {
+	return "changes the number of CPUs and the total memory of a running sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Resize) Usage() string {
+	return `resize [flags] <container id>
+
+Changes the number of CPUs and the total memory that applications in the
+sandbox of the given container see, e.g. in /proc/cpuinfo, /proc/meminfo,
+sched_getaffinity(2) and sysinfo(2). If the new total memory is below the
+current memory usage, the sandbox reclaims memory as it does under host memory
+pressure.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (r *Resize) SetFlags(f *flag.FlagSet) {
+	f.UintVar(&r.cpus, "cpus", 0, "number of CPUs visible to the sandbox. 0 leaves it unchanged")
+	f.Uint64Var(&r.memory, "memory", 0, "total memory of the sandbox in bytes. 0 leaves it unchanged")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (r *Resize) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	if r.cpus == 0 && r.memory == 0 {
+		util.Fatalf("at least one of --cpus and --memory must be given")
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if err := c.Resize(r.cpus, r.memory); err != nil {
+		util.Fatalf("resizing sandbox: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// ResizeTTY implements subcommands.Command for the "resize-tty" command.
+type ResizeTTY struct {
+	pid int
+}
+
+// Name implements subcommands.Command.Name.
+func (*ResizeTTY) Name() string {
+	return "resize-tty"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*ResizeTTY) Synopsis() string {
+	return "sets the window size of a container process' terminal"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*ResizeTTY) Usage() string {
+	return `resize-tty [flags] <container id> <rows> <columns>
+
+Sets the window size of the terminal attached to the container's init process,
+or to the given process, and sends SIGWINCH to its foreground process group if
+the size changed.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (r *ResizeTTY) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&r.pid, "pid", 0, "resize the terminal of a specific process. pid is relative to the root PID namespace")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (r *ResizeTTY) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 3 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	rows, err := strconv.ParseUint(f.Arg(1), 10, 16)
+	if err != nil {
+		util.Fatalf("invalid number of rows %q: %v", f.Arg(1), err)
+	}
+	cols, err := strconv.ParseUint(f.Arg(2), 10, 16)
+	if err != nil {
+		util.Fatalf("invalid number of columns %q: %v", f.Arg(2), err)
+	}
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	ws := linux.Winsize{Row: uint16(rows), Col: uint16(cols)}
+	if err := c.ResizeTTY(int32(r.pid), ws); err != nil {
+		util.Fatalf("resizing terminal: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
@@ -16,6 +16,8 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/google/subcommands"
@@ -24,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/remote"
 	"gvisor.dev/gvisor/runsc/specutils"
 )
 
@@ -35,8 +38,20 @@ type Restore struct {
 	// imagePath is the path to the saved container image
 	imagePath string
 
+	// imageFD is a host file descriptor from which the saved container image
+	// is read, instead of from imagePath. It is -1 if unset.
+	imageFD int
+
 	// detach indicates that runsc has to start a process and exit without waiting it.
 	detach bool
+
+	// lazyPages indicates that the contents of memory are loaded on demand
+	// after the container is restored.
+	lazyPages bool
+
+	// encryptionKeyFD is a host file descriptor from which the key that the
+	// image was encrypted with is read. It is -1 if unset.
+	encryptionKeyFD int
 }
 
 // Name implements subcommands.Command.Name.
@@ -52,6 +67,21 @@ func (*Restore) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Restore) Usage() string {
 	return `restore [flags] <container id> - restore saved state of container.
+
+The saved state is read from the image directory given by --image-path, or
+streamed from the file descriptor given by --image-fd, e.g.:
+
+	curl -s https://example.com/checkpoint.img | runsc restore --image-fd=0 <container id>
+
+If --image-path is an http:// or https:// URL that checkpoint uploaded an image
+to, the image is downloaded to a temporary directory first, and every chunk of
+it is checked against the hashes in the image's manifest before the container
+is restored.
+
+Images encrypted by checkpoint --encryption-key-fd are restored by passing the
+same key with --encryption-key-fd. Restore fails if the key is wrong or the
+image has been tampered with. Unencrypted images can still be restored with a
+key, but a warning is logged as they aren't authenticated.
 `
 }
 
@@ -59,7 +89,10 @@ func (*Restore) Usage() string {
 func (r *Restore) SetFlags(f *flag.FlagSet) {
 	r.Create.SetFlags(f)
 	f.StringVar(&r.imagePath, "image-path", "", "directory path to saved container image")
+	f.IntVar(&r.imageFD, "image-fd", -1, "file descriptor to read a saved container image from, e.g. a pipe; incompatible with image-path and lazy-pages")
 	f.BoolVar(&r.detach, "detach", false, "detach from the container's process")
+	f.BoolVar(&r.lazyPages, "lazy-pages", false, "load the container's memory on demand after restoring it")
+	f.IntVar(&r.encryptionKeyFD, "encryption-key-fd", -1, "file descriptor to read the 32-byte key that the container image was encrypted with from")
 
 	// Unimplemented flags necessary for compatibility with docker.
 
@@ -95,12 +128,18 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...interface{
 	}
 	specutils.LogSpec(spec)
 
-	if r.imagePath == "" {
-		return util.Errorf("image-path flag must be provided")
+	if r.encryptionKeyFD >= 0 {
+		// Encrypted images contain the contents of memory inline.
+		if r.lazyPages {
+			return util.Errorf("lazy-pages can't be used with encryption-key-fd")
+		}
+		key, err := readEncryptionKey(r.encryptionKeyFD)
+		if err != nil {
+			return util.Errorf("%v", err)
+		}
+		conf.RestoreEncryptionKey = key
 	}
 
-	conf.RestoreFile = filepath.Join(r.imagePath, checkpointFileName)
-
 	runArgs := container.Args{
 		ID:            id,
 		Spec:          spec,
@@ -110,6 +149,35 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...interface{
 		UserLog:       r.userLog,
 		Attached:      !r.detach,
 	}
+	if r.imageFD >= 0 {
+		if r.imagePath != "" {
+			return util.Errorf("image-path and image-fd flags are mutually exclusive")
+		}
+		// Streamed images contain the contents of memory inline, but memory
+		// can only be loaded lazily from a separate pages file, which must be
+		// read out of order.
+		if r.lazyPages {
+			return util.Errorf("lazy-pages can't be used with image-fd")
+		}
+		image := os.NewFile(uintptr(r.imageFD), "checkpoint image")
+		defer image.Close()
+		runArgs.RestoreImage = image
+	} else if r.imagePath == "" {
+		return util.Errorf("image-path or image-fd flag must be provided")
+	} else if remote.IsURL(r.imagePath) {
+		dir, err := downloadImage(r.imagePath)
+		if err != nil {
+			return util.Errorf("%v", err)
+		}
+		// The sandbox has opened the image files by the time Run returns.
+		defer os.RemoveAll(dir)
+		if err := r.setRestoreFiles(conf, dir); err != nil {
+			return util.Errorf("%v", err)
+		}
+	} else if err := r.setRestoreFiles(conf, r.imagePath); err != nil {
+		return util.Errorf("%v", err)
+	}
+
 	ws, err := container.Run(conf, runArgs)
 	if err != nil {
 		return util.Errorf("running container: %v", err)
@@ -118,3 +186,40 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...interface{
 
 	return subcommands.ExitSuccess
 }
+
+// setRestoreFiles sets the paths of the files in the image directory dir that
+// conf is restored from.
+func (r *Restore) setRestoreFiles(conf *config.Config, dir string) error {
+	conf.RestoreFile = filepath.Join(dir, checkpointFileName)
+
+	// Images saved before memory was written to a separate pages file
+	// can only be restored eagerly.
+	pagesPath := filepath.Join(dir, pagesFileName)
+	if _, err := os.Stat(pagesPath); err == nil {
+		conf.RestorePagesFile = pagesPath
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("checking for pages file: %v", err)
+	} else if r.lazyPages {
+		return fmt.Errorf("lazy-pages requires a pages file in image-path")
+	}
+	conf.RestoreLazyPages = r.lazyPages
+	return nil
+}
+
+// downloadImage downloads the image at rawURL to a new temporary directory,
+// which it returns.
+func downloadImage(rawURL string) (string, error) {
+	store, err := remote.NewStore(rawURL)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "runsc-restore-")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary image directory: %v", err)
+	}
+	if err := store.DownloadDir(context.Background(), dir); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("downloading image: %v", err)
+	}
+	return dir, nil
+}
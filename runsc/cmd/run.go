@@ -69,8 +69,8 @@ func (r *Run) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) s
 	waitStatus := args[1].(*unix.WaitStatus)
 
 	if conf.Rootless {
-		if conf.Network == config.NetworkSandbox {
-			return util.Errorf("sandbox network isn't supported with --rootless, use --network=none or --network=host")
+		if conf.Network == config.NetworkSandbox || conf.Network == config.NetworkDHCP {
+			return util.Errorf("%s network isn't supported with --rootless, use --network=none or --network=host", conf.Network)
 		}
 
 		if err := specutils.MaybeRunAsRoot(); err != nil {
@@ -15,11 +15,18 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"os/exec"
+	osuser "os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/google/subcommands"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -27,7 +34,44 @@ import (
 	"gvisor.dev/gvisor/runsc/flag"
 )
 
-func writeSpec(w io.Writer, cwd string, netns string, args []string) error {
+// specOptions are the options used to generate a spec.
+type specOptions struct {
+	// cwd is the working directory of the container process.
+	cwd string
+
+	// netns is the path of a network namespace to join, or empty to create a
+	// new network namespace.
+	netns string
+
+	// args are the arguments of the container process.
+	args []string
+
+	// uidMappings and gidMappings are the ID mappings of the container's user
+	// namespace. If both are empty, the spec doesn't create a user namespace.
+	uidMappings []specs.LinuxIDMapping
+	gidMappings []specs.LinuxIDMapping
+
+	// tmpSize and shmSize are the sizes of tmpfs mounts on /tmp and /dev/shm,
+	// in the format of the tmpfs size mount option. If empty, the
+	// corresponding mount is not added.
+	tmpSize string
+	shmSize string
+
+	// memoryLimit is the memory limit of the container in bytes, or 0 for no
+	// limit.
+	memoryLimit int64
+
+	// cpus is the number of CPUs that the container may use, or 0 for no
+	// limit.
+	cpus float64
+
+	// pidsLimit is the maximum number of tasks in the container, or 0 for no
+	// limit.
+	pidsLimit int64
+}
+
+// newSpec returns a new spec configured according to opts.
+func newSpec(opts *specOptions) *specs.Spec {
 	spec := &specs.Spec{
 		Version: "1.0.0",
 		Process: &specs.Process{
@@ -35,12 +79,12 @@ func writeSpec(w io.Writer, cwd string, netns string, args []string) error {
 				UID: 0,
 				GID: 0,
 			},
-			Args: args,
+			Args: opts.args,
 			Env: []string{
 				"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
 				"TERM=xterm",
 			},
-			Cwd: cwd,
+			Cwd: opts.cwd,
 			Capabilities: &specs.LinuxCapabilities{
 				Bounding: []string{
 					"CAP_AUDIT_WRITE",
@@ -107,7 +151,7 @@ func writeSpec(w io.Writer, cwd string, netns string, args []string) error {
 				},
 				{
 					Type: "network",
-					Path: netns,
+					Path: opts.netns,
 				},
 				{
 					Type: "ipc",
@@ -122,6 +166,51 @@ func writeSpec(w io.Writer, cwd string, netns string, args []string) error {
 		},
 	}
 
+	for _, m := range []struct {
+		dest    string
+		size    string
+		options []string
+	}{
+		{dest: "/tmp", size: opts.tmpSize, options: []string{"nosuid", "nodev"}},
+		{dest: "/dev/shm", size: opts.shmSize, options: []string{"nosuid", "noexec", "nodev"}},
+	} {
+		if m.size == "" {
+			continue
+		}
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Destination: m.dest,
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     append(m.options, "size="+m.size),
+		})
+	}
+
+	if len(opts.uidMappings) > 0 || len(opts.gidMappings) > 0 {
+		spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+		spec.Linux.UIDMappings = opts.uidMappings
+		spec.Linux.GIDMappings = opts.gidMappings
+	}
+
+	if opts.memoryLimit > 0 || opts.cpus > 0 || opts.pidsLimit > 0 {
+		resources := &specs.LinuxResources{}
+		if opts.memoryLimit > 0 {
+			resources.Memory = &specs.LinuxMemory{Limit: &opts.memoryLimit}
+		}
+		if opts.cpus > 0 {
+			period := uint64(100000)
+			quota := int64(opts.cpus * float64(period))
+			resources.CPU = &specs.LinuxCPU{Period: &period, Quota: &quota}
+		}
+		if opts.pidsLimit > 0 {
+			resources.Pids = &specs.LinuxPids{Limit: opts.pidsLimit}
+		}
+		spec.Linux.Resources = resources
+	}
+	return spec
+}
+
+func writeSpec(w io.Writer, opts *specOptions) error {
+	spec := newSpec(opts)
 	e := json.NewEncoder(w)
 	e.SetIndent("", "    ")
 	return e.Encode(spec)
@@ -129,9 +218,15 @@ func writeSpec(w io.Writer, cwd string, netns string, args []string) error {
 
 // Spec implements subcommands.Command for the "spec" command.
 type Spec struct {
-	bundle string
-	cwd    string
-	netns  string
+	bundle      string
+	cwd         string
+	netns       string
+	rootless    bool
+	tmpSize     string
+	shmSize     string
+	memoryLimit string
+	cpus        float64
+	pidsLimit   int64
 }
 
 // Name implements subcommands.Command.Name.
@@ -161,6 +256,11 @@ You can find out more about the format of the specification file by visiting
 the OCI runtime spec repository:
 https://github.com/opencontainers/runtime-spec/
 
+With --rootless, the spec creates a user namespace that maps root in the
+container to the current user, and other IDs to the current user's subordinate
+ID ranges in /etc/subuid and /etc/subgid. This requires newuidmap(1) and
+newgidmap(1).
+
 EXAMPLE:
     $ mkdir -p bundle/rootfs
     $ cd bundle
@@ -168,6 +268,9 @@ EXAMPLE:
     $ docker export $(docker create hello-world) | tar -xf - -C rootfs
     $ sudo runsc run hello
 
+    $ runsc spec --rootless --tmp-size=64m --memory=512m --cpus=1.5 -- /hello
+    $ runsc --rootless run hello
+
 `
 }
 
@@ -176,7 +279,13 @@ func (s *Spec) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&s.bundle, "bundle", ".", "path to the root of the OCI bundle")
 	f.StringVar(&s.cwd, "cwd", "/", "working directory that will be set for the executable, "+
 		"this value MUST be an absolute path")
-	f.StringVar(&s.netns, "netns", "", "network namespace path")
+	f.StringVar(&s.netns, "netns", "", "path of an existing network namespace to join")
+	f.BoolVar(&s.rootless, "rootless", false, "create a user namespace that maps root in the container to the current user, and other IDs to the current user's subordinate ID ranges in /etc/subuid and /etc/subgid. Use with runsc --rootless")
+	f.StringVar(&s.tmpSize, "tmp-size", "", "if set, mount a tmpfs of the given size (e.g. 64m) on /tmp")
+	f.StringVar(&s.shmSize, "shm-size", "", "if set, mount a tmpfs of the given size (e.g. 64m) on /dev/shm")
+	f.StringVar(&s.memoryLimit, "memory", "", "if set, limit the memory of the container to the given size (e.g. 512m)")
+	f.Float64Var(&s.cpus, "cpus", 0, "if set, limit the container to the given number of CPUs")
+	f.Int64Var(&s.pidsLimit, "pids-limit", 0, "if set, limit the number of tasks in the container")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -187,6 +296,11 @@ func (s *Spec) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		containerArgs = []string{"sh"}
 	}
 
+	opts, err := s.specOptions(containerArgs)
+	if err != nil {
+		util.Fatalf("%v", err)
+	}
+
 	confPath := filepath.Join(s.bundle, "config.json")
 	if _, err := os.Stat(confPath); !os.IsNotExist(err) {
 		util.Fatalf("file %q already exists", confPath)
@@ -197,10 +311,183 @@ func (s *Spec) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		util.Fatalf("opening file %q: %v", confPath, err)
 	}
 
-	err = writeSpec(configFile, s.cwd, s.netns, containerArgs)
+	err = writeSpec(configFile, opts)
 	if err != nil {
 		util.Fatalf("writing to %q: %v", confPath, err)
 	}
 
 	return subcommands.ExitSuccess
 }
+
+// specOptions validates the flags of s and returns the corresponding
+// specOptions.
+func (s *Spec) specOptions(args []string) (*specOptions, error) {
+	opts := &specOptions{
+		cwd:       s.cwd,
+		netns:     s.netns,
+		args:      args,
+		tmpSize:   s.tmpSize,
+		shmSize:   s.shmSize,
+		cpus:      s.cpus,
+		pidsLimit: s.pidsLimit,
+	}
+	if !filepath.IsAbs(s.cwd) {
+		return nil, fmt.Errorf("--cwd must be an absolute path, got %q", s.cwd)
+	}
+	if s.netns != "" {
+		if _, err := os.Stat(s.netns); err != nil {
+			return nil, fmt.Errorf("--netns: %w; create the network namespace first, e.g. with \"ip netns add\", and pass its path, e.g. /var/run/netns/<name>", err)
+		}
+	}
+	for _, size := range []struct {
+		flag  string
+		value string
+	}{
+		{flag: "tmp-size", value: s.tmpSize},
+		{flag: "shm-size", value: s.shmSize},
+	} {
+		if size.value == "" {
+			continue
+		}
+		if _, err := parseSize(size.value); err != nil {
+			return nil, fmt.Errorf("--%s: %w", size.flag, err)
+		}
+	}
+	if s.memoryLimit != "" {
+		limit, err := parseSize(s.memoryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("--memory: %w", err)
+		}
+		opts.memoryLimit = limit
+	}
+	if s.cpus < 0 {
+		return nil, fmt.Errorf("--cpus must not be negative, got %v", s.cpus)
+	}
+	if s.pidsLimit < 0 {
+		return nil, fmt.Errorf("--pids-limit must not be negative, got %d", s.pidsLimit)
+	}
+	if s.rootless {
+		if err := rootlessMappings(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// parseSize parses a size in bytes with an optional k, m, g or t suffix, as
+// accepted by the tmpfs size mount option.
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+	s := size
+	shift := 0
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		shift = 10
+	case 'm', 'M':
+		shift = 20
+	case 'g', 'G':
+		shift = 30
+	case 't', 'T':
+		shift = 40
+	}
+	if shift != 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("invalid size %q: must be a positive number of bytes, optionally followed by k, m, g or t", size)
+	}
+	return n << shift, nil
+}
+
+// rootlessMappings sets the ID mappings of opts for rootless mode: root in the
+// container is mapped to the current user and group, and IDs starting from 1
+// are mapped to their subordinate ID ranges. This is the mapping that runsc
+// sets up with newuidmap(1) and newgidmap(1) in rootless mode.
+func rootlessMappings(opts *specOptions) error {
+	u, err := osuser.Current()
+	if err != nil {
+		return fmt.Errorf("getting current user: %w", err)
+	}
+	g, err := osuser.LookupGroupId(strconv.Itoa(os.Getgid()))
+	if err != nil {
+		return fmt.Errorf("getting current group: %w", err)
+	}
+	for _, tool := range []string{"newuidmap", "newgidmap"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("--rootless requires %s, which is not installed: install it, e.g. from the uidmap package", tool)
+		}
+	}
+
+	uid, err := subIDMapping("/etc/subuid", u.Username, u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := subIDMapping("/etc/subgid", g.Name, g.Gid)
+	if err != nil {
+		return err
+	}
+	opts.uidMappings = []specs.LinuxIDMapping{
+		{ContainerID: 0, HostID: uint32(os.Getuid()), Size: 1},
+		uid,
+	}
+	opts.gidMappings = []specs.LinuxIDMapping{
+		{ContainerID: 0, HostID: uint32(os.Getgid()), Size: 1},
+		gid,
+	}
+	return nil
+}
+
+// subIDMapping returns a mapping of container IDs starting from 1 to the first
+// subordinate ID range of the user or group with the given name or ID in the
+// subordinate ID file at path, e.g. /etc/subuid.
+func subIDMapping(path, name, id string) (specs.LinuxIDMapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return specs.LinuxIDMapping{}, fmt.Errorf("--rootless requires subordinate ID ranges: %w", err)
+	}
+	defer f.Close()
+	m, err := findSubIDRange(f, name, id)
+	if err != nil {
+		return specs.LinuxIDMapping{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if m.Size == 0 {
+		return specs.LinuxIDMapping{}, fmt.Errorf("no subordinate ID range for %q in %s; add one, e.g. with \"usermod --add-subuids 100000-165535 --add-subgids 100000-165535 %s\"", name, path, name)
+	}
+	return m, nil
+}
+
+// findSubIDRange returns a mapping of container IDs starting from 1 to the
+// first range in r, in the format of subuid(5), that belongs to name or id. If
+// there is no such range, it returns a mapping of size 0.
+func findSubIDRange(r io.Reader, name, id string) (specs.LinuxIDMapping, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != 3 {
+			return specs.LinuxIDMapping{}, fmt.Errorf("invalid line %q", line)
+		}
+		if fields[0] != name && fields[0] != id {
+			continue
+		}
+		start, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return specs.LinuxIDMapping{}, fmt.Errorf("invalid line %q: %w", line, err)
+		}
+		count, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return specs.LinuxIDMapping{}, fmt.Errorf("invalid line %q: %w", line, err)
+		}
+		if count == 0 {
+			continue
+		}
+		return specs.LinuxIDMapping{ContainerID: 1, HostID: uint32(start), Size: uint32(count)}, nil
+	}
+	return specs.LinuxIDMapping{}, scanner.Err()
+}
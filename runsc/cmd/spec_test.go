@@ -0,0 +1,159 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+func TestParseSize(t *testing.T) {
+	for _, tc := range []struct {
+		size string
+		want int64
+		err  bool
+	}{
+		{size: "4096", want: 4096},
+		{size: "64k", want: 64 << 10},
+		{size: "64m", want: 64 << 20},
+		{size: "2G", want: 2 << 30},
+		{size: "1t", want: 1 << 40},
+		{size: "", err: true},
+		{size: "m", err: true},
+		{size: "0", err: true},
+		{size: "-1m", err: true},
+		{size: "1.5g", err: true},
+		{size: "64x", err: true},
+		{size: "9999999999t", err: true},
+	} {
+		t.Run(tc.size, func(t *testing.T) {
+			got, err := parseSize(tc.size)
+			if tc.err {
+				if err == nil {
+					t.Errorf("parseSize(%q) = %d, want error", tc.size, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSize(%q) failed: %v", tc.size, err)
+			}
+			if got != tc.want {
+				t.Errorf("parseSize(%q) = %d, want %d", tc.size, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFindSubIDRange(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    specs.LinuxIDMapping
+		err     bool
+	}{
+		{
+			name:    "by name",
+			content: "other:100000:65536\nuser:165536:65536\n",
+			want:    specs.LinuxIDMapping{ContainerID: 1, HostID: 165536, Size: 65536},
+		},
+		{
+			name:    "by id",
+			content: "1000:200000:1000\n",
+			want:    specs.LinuxIDMapping{ContainerID: 1, HostID: 200000, Size: 1000},
+		},
+		{
+			name:    "first range",
+			content: "# comment\n\nuser:0:0\nuser:100000:10\nuser:300000:20\n",
+			want:    specs.LinuxIDMapping{ContainerID: 1, HostID: 100000, Size: 10},
+		},
+		{
+			name:    "missing",
+			content: "other:100000:65536\n",
+		},
+		{
+			name:    "invalid line",
+			content: "user:100000\n",
+			err:     true,
+		},
+		{
+			name:    "invalid count",
+			content: "user:100000:lots\n",
+			err:     true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := findSubIDRange(strings.NewReader(tc.content), "user", "1000")
+			if tc.err {
+				if err == nil {
+					t.Errorf("findSubIDRange() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findSubIDRange() failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("findSubIDRange() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewSpecValid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts specOptions
+	}{
+		{
+			name: "default",
+			opts: specOptions{cwd: "/", args: []string{"sh"}},
+		},
+		{
+			name: "all options",
+			opts: specOptions{
+				cwd:   "/",
+				netns: "/var/run/netns/test",
+				args:  []string{"/hello"},
+				uidMappings: []specs.LinuxIDMapping{
+					{ContainerID: 0, HostID: 1000, Size: 1},
+					{ContainerID: 1, HostID: 100000, Size: 65536},
+				},
+				gidMappings: []specs.LinuxIDMapping{
+					{ContainerID: 0, HostID: 1000, Size: 1},
+					{ContainerID: 1, HostID: 100000, Size: 65536},
+				},
+				tmpSize:     "64m",
+				shmSize:     "32m",
+				memoryLimit: 512 << 20,
+				cpus:        1.5,
+				pidsLimit:   100,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := newSpec(&tc.opts)
+			if err := specutils.ValidateSpec(spec); err != nil {
+				t.Fatalf("ValidateSpec() failed: %v", err)
+			}
+			_, got := specutils.GetNS(specs.UserNamespace, spec)
+			if want := len(tc.opts.uidMappings) > 0; got != want {
+				t.Errorf("GetNS(%q) = %t, want %t", specs.UserNamespace, got, want)
+			}
+		})
+	}
+}
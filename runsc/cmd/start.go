@@ -20,8 +20,8 @@ import (
 	"github.com/google/subcommands"
 	"gvisor.dev/gvisor/runsc/cmd/util"
 	"gvisor.dev/gvisor/runsc/config"
-	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/lib"
 	"gvisor.dev/gvisor/runsc/specutils"
 )
 
@@ -56,17 +56,17 @@ func (*Start) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) s
 	id := f.Arg(0)
 	conf := args[0].(*config.Config)
 
-	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	c, err := lib.Load(conf, id)
 	if err != nil {
 		util.Fatalf("loading container: %v", err)
 	}
 	// Read the spec again here to ensure flag annotations from the spec are
 	// applied to "conf".
-	if _, err := specutils.ReadSpec(c.BundleDir, conf); err != nil {
+	if _, err := specutils.ReadSpec(c.BundleDir(), conf); err != nil {
 		util.Fatalf("reading spec: %v", err)
 	}
 
-	if err := c.Start(conf); err != nil {
+	if err := c.Start(); err != nil {
 		util.Fatalf("starting container: %v", err)
 	}
 	return subcommands.ExitSuccess
@@ -74,10 +74,14 @@ func (l *delete) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}
 		util.Fatalf("loading sandbox: %v", err)
 	}
 
-	if err := c.Sandbox.DeleteTraceSession(l.sessionName); err != nil {
+	session, err := c.Sandbox.DeleteTraceSession(l.sessionName)
+	if err != nil {
 		util.Fatalf("deleting session: %v", err)
 	}
 
 	fmt.Printf("Trace session %q deleted.\n", l.sessionName)
+	for _, sink := range session.Sinks {
+		fmt.Printf("\tSink: %q, dropped: %d\n", sink.Name, sink.Status.DroppedCount)
+	}
 	return subcommands.ExitSuccess
 }
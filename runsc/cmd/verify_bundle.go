@@ -0,0 +1,301 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/runsc/cgroup"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// Statuses of a verify-bundle check.
+const (
+	checkOK      = "ok"
+	checkWarning = "warning"
+	checkError   = "error"
+)
+
+// bundleCheck is the result of a single verify-bundle check.
+type bundleCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// VerifyBundle implements subcommands.Command for the "verify-bundle" command.
+type VerifyBundle struct {
+	format string
+}
+
+// Name implements subcommands.Command.Name.
+func (*VerifyBundle) Name() string {
+	return "verify-bundle"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*VerifyBundle) Synopsis() string {
+	return "check that a bundle can be run on this host, without running it"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*VerifyBundle) Usage() string {
+	return `verify-bundle [flags] <bundle>
+
+Checks the spec in <bundle> against this host and the runsc flags in use: that
+mount sources exist and are accessible, that the platform can be initialized,
+that the cgroup controllers needed by the resources are available, that the
+user namespace mappings can be applied, and that namespace paths are valid.
+
+Prints one line per check. Exits with an error status only if a check failed;
+warnings describe setups that run, but in a degraded mode.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (v *VerifyBundle) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&v.format, "format", "text", "output format: 'text' (default) or 'json'")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (v *VerifyBundle) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	if v.format != "text" && v.format != "json" {
+		util.Fatalf("unknown verify-bundle format %q", v.format)
+	}
+	conf := args[0].(*config.Config)
+
+	checks := verifyBundle(f.Arg(0), conf)
+
+	failed := false
+	for _, c := range checks {
+		if c.Status == checkError {
+			failed = true
+		}
+	}
+	switch v.format {
+	case "text":
+		for _, c := range checks {
+			fmt.Fprintf(os.Stdout, "%-7s %s: %s\n", strings.ToUpper(c.Status), c.Name, c.Message)
+		}
+	case "json":
+		if err := json.NewEncoder(os.Stdout).Encode(checks); err != nil {
+			util.Fatalf("marshaling checks: %v", err)
+		}
+	}
+	if failed {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// verifyBundle runs all checks against the bundle in bundleDir.
+func verifyBundle(bundleDir string, conf *config.Config) []bundleCheck {
+	spec, err := specutils.ReadSpec(bundleDir, conf)
+	if err != nil {
+		return []bundleCheck{{Name: "spec", Status: checkError, Message: err.Error()}}
+	}
+	checks := []bundleCheck{{Name: "spec", Status: checkOK, Message: fmt.Sprintf("read and validated the spec in %q", bundleDir)}}
+	checks = append(checks, checkRoot(spec))
+	checks = append(checks, checkMounts(spec)...)
+	checks = append(checks, checkPlatform(conf))
+	checks = append(checks, checkCgroups(spec, conf))
+	checks = append(checks, checkUserNS(spec))
+	checks = append(checks, checkNamespaces(spec)...)
+	return checks
+}
+
+// checkAccess checks that path exists and grants the given access, using
+// the effective credentials that the gofer will have. A read-only host
+// filesystem for a writable path is only a warning, since the gofer then
+// fails writes but otherwise serves the path.
+func checkAccess(name, path string, writable bool) bundleCheck {
+	if _, err := os.Stat(path); err != nil {
+		return bundleCheck{Name: name, Status: checkError, Message: err.Error()}
+	}
+	if err := unix.Faccessat(unix.AT_FDCWD, path, unix.R_OK, unix.AT_EACCESS); err != nil {
+		return bundleCheck{Name: name, Status: checkError, Message: fmt.Sprintf("%q is not readable: %v", path, err)}
+	}
+	if writable {
+		if err := unix.Faccessat(unix.AT_FDCWD, path, unix.W_OK, unix.AT_EACCESS); err == unix.EROFS {
+			return bundleCheck{Name: name, Status: checkWarning, Message: fmt.Sprintf("%q is on a read-only filesystem, writes will fail; mark the mount \"ro\" to silence this", path)}
+		} else if err != nil {
+			return bundleCheck{Name: name, Status: checkError, Message: fmt.Sprintf("%q is not writable: %v", path, err)}
+		}
+	}
+	return bundleCheck{Name: name, Status: checkOK, Message: fmt.Sprintf("%q is accessible", path)}
+}
+
+func checkRoot(spec *specs.Spec) bundleCheck {
+	return checkAccess("root", spec.Root.Path, !spec.Root.Readonly)
+}
+
+func checkMounts(spec *specs.Spec) []bundleCheck {
+	var checks []bundleCheck
+	for _, m := range spec.Mounts {
+		if !specutils.IsGoferMount(m) {
+			continue
+		}
+		name := fmt.Sprintf("mount %q", m.Destination)
+		checks = append(checks, checkAccess(name, m.Source, specutils.OptionsToFlags(m.Options)&unix.MS_RDONLY == 0))
+	}
+	return checks
+}
+
+// checkPlatform checks that the platform selected by conf can be created,
+// the same way the sandbox creates it.
+func checkPlatform(conf *config.Config) (c bundleCheck) {
+	c.Name = fmt.Sprintf("platform %q", conf.Platform)
+	p, err := platform.Lookup(conf.Platform)
+	if err != nil {
+		c.Status = checkError
+		c.Message = err.Error()
+		return c
+	}
+	deviceFile, err := p.OpenDevice(conf.PlatformDevicePath)
+	if err != nil {
+		c.Status = checkError
+		c.Message = fmt.Sprintf("opening device file: %v", err)
+		return c
+	}
+	if deviceFile != nil {
+		defer deviceFile.Close()
+	}
+	// Some platforms panic instead of returning an error when they fail to
+	// initialize.
+	defer func() {
+		if r := recover(); r != nil {
+			c.Status = checkError
+			c.Message = fmt.Sprintf("initializing platform: %v", r)
+		}
+	}()
+	if _, err := p.New(deviceFile); err != nil {
+		c.Status = checkError
+		c.Message = fmt.Sprintf("initializing platform: %v", err)
+		return c
+	}
+	c.Status = checkOK
+	c.Message = "initialized"
+	return c
+}
+
+func checkCgroups(spec *specs.Spec, conf *config.Config) bundleCheck {
+	c := bundleCheck{Name: "cgroups"}
+	if spec.Linux == nil || spec.Linux.CgroupsPath == "" {
+		c.Status = checkOK
+		c.Message = "no cgroup requested"
+		return c
+	}
+	if conf.IgnoreCgroups {
+		c.Status = checkWarning
+		c.Message = "cgroups are ignored because of --ignore-cgroups, resource limits are not enforced"
+		return c
+	}
+	skipped, err := cgroup.CheckControllers(spec.Linux.Resources)
+	if err != nil {
+		c.Status = checkError
+		c.Message = err.Error()
+		return c
+	}
+	if len(skipped) > 0 {
+		c.Status = checkWarning
+		c.Message = fmt.Sprintf("controllers %s are not available and will be skipped", strings.Join(skipped, ", "))
+		return c
+	}
+	c.Status = checkOK
+	c.Message = "all controllers are available"
+	return c
+}
+
+// checkUserNS checks that the uid/gid mappings in the spec can be applied, by
+// starting a short lived process in a new user namespace with them.
+func checkUserNS(spec *specs.Spec) bundleCheck {
+	c := bundleCheck{Name: "user namespace"}
+	ns, ok := specutils.GetNS(specs.UserNamespace, spec)
+	if !ok || ns.Path != "" {
+		c.Status = checkOK
+		c.Message = "no user namespace created"
+		return c
+	}
+	cmd := exec.Command(specutils.ExePath, "help")
+	cmd.SysProcAttr = &unix.SysProcAttr{Cloneflags: unix.CLONE_NEWUSER}
+	specutils.SetUIDGIDMappings(cmd, spec)
+	if err := cmd.Run(); err != nil {
+		c.Status = checkError
+		c.Message = fmt.Sprintf("applying uid/gid mappings: %v", err)
+		return c
+	}
+	c.Status = checkOK
+	c.Message = "uid/gid mappings can be applied"
+	return c
+}
+
+// namespaceTypes are the namespace types that runsc can join.
+var namespaceTypes = []specs.LinuxNamespaceType{
+	specs.CgroupNamespace,
+	specs.IPCNamespace,
+	specs.MountNamespace,
+	specs.NetworkNamespace,
+	specs.PIDNamespace,
+	specs.UserNamespace,
+	specs.UTSNamespace,
+}
+
+func checkNamespaces(spec *specs.Spec) []bundleCheck {
+	if spec.Linux == nil {
+		return nil
+	}
+	var checks []bundleCheck
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Path == "" {
+			continue
+		}
+		c := bundleCheck{Name: fmt.Sprintf("%v namespace", ns.Type)}
+		known := false
+		for _, t := range namespaceTypes {
+			if ns.Type == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			c.Status = checkError
+			c.Message = fmt.Sprintf("namespace type %q is not supported", ns.Type)
+		} else if err := specutils.ValidateNSPath(ns); err != nil {
+			c.Status = checkError
+			c.Message = err.Error()
+		} else {
+			c.Status = checkOK
+			c.Message = fmt.Sprintf("%q is valid", ns.Path)
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestVerifyBundleMounts(t *testing.T) {
+	dir := t.TempDir()
+	spec := &specs.Spec{
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/present", Type: "bind", Source: dir, Options: []string{"ro"}},
+			{Destination: "/missing", Type: "bind", Source: filepath.Join(dir, "missing")},
+		},
+	}
+	checks := checkMounts(spec)
+	if len(checks) != 2 {
+		t.Fatalf("checkMounts returned %d checks, want 2: %+v", len(checks), checks)
+	}
+	if got := checks[0].Status; got != checkOK {
+		t.Errorf("check of existing mount source has status %q, want %q: %+v", got, checkOK, checks[0])
+	}
+	if got := checks[1].Status; got != checkError {
+		t.Errorf("check of missing mount source has status %q, want %q: %+v", got, checkError, checks[1])
+	}
+}
+
+func TestVerifyBundleNamespaces(t *testing.T) {
+	spec := &specs.Spec{
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.NetworkNamespace, Path: "/proc/self/ns/net"},
+				{Type: specs.UTSNamespace, Path: "/proc/self/ns/net"},
+				{Type: specs.IPCNamespace, Path: t.TempDir()},
+				{Type: specs.PIDNamespace},
+			},
+		},
+	}
+	checks := checkNamespaces(spec)
+	want := []string{checkOK, checkError, checkError}
+	if len(checks) != len(want) {
+		t.Fatalf("checkNamespaces returned %d checks, want %d: %+v", len(checks), len(want), checks)
+	}
+	for i, c := range checks {
+		if c.Status != want[i] {
+			t.Errorf("check %d has status %q, want %q: %+v", i, c.Status, want[i], c)
+		}
+	}
+}
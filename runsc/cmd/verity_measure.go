@@ -0,0 +1,149 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/merkletree"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// VerityMeasure implements subcommands.Command for the "verity-measure"
+// command.
+type VerityMeasure struct{}
+
+// Name implements subcommands.Command.
+func (*VerityMeasure) Name() string {
+	return "verity-measure"
+}
+
+// Synopsis implements subcommands.Command.
+func (*VerityMeasure) Synopsis() string {
+	return "generates the Merkle trees of a directory for verity mounts and prints its root hash"
+}
+
+// Usage implements subcommands.Command.
+func (*VerityMeasure) Usage() string {
+	return `verity-measure <directory>
+
+Writes a tree file next to every file in <directory>, and prints the root hash
+to be given in the "dev.gvisor.spec.mount.<name>.verity" annotation of a verity
+mount of the directory. The directory must not be modified afterwards; any
+change, including to file ownership or permissions, makes the affected files
+unusable in the sandbox until the directory is measured again.
+`
+}
+
+// SetFlags implements subcommands.Command.
+func (*VerityMeasure) SetFlags(*flag.FlagSet) {}
+
+// Execute implements subcommands.Command.Execute.
+func (*VerityMeasure) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	dir := f.Arg(0)
+	rootHash, err := measureVerity(dir, filepath.Join(dir, merkletree.TreeFileName("")))
+	if err != nil {
+		util.Fatalf("measuring %q: %v", dir, err)
+	}
+	fmt.Println(hex.EncodeToString(rootHash))
+	return subcommands.ExitSuccess
+}
+
+// measureVerity writes the tree file for the file at path to treePath, after
+// recursively measuring its children if it is a directory, and returns the
+// digest of its descriptor.
+func measureVerity(path, treePath string) ([]byte, error) {
+	var stat unix.Stat_t
+	if err := unix.Lstat(path, &stat); err != nil {
+		return nil, fmt.Errorf("stat %q: %w", path, err)
+	}
+	desc := merkletree.Descriptor{
+		Mode: stat.Mode,
+		UID:  stat.Uid,
+		GID:  stat.Gid,
+	}
+
+	var payload []byte
+	switch stat.Mode & unix.S_IFMT {
+	case unix.S_IFREG:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		desc.Size = stat.Size
+		payload, desc.Root, err = merkletree.Generate(f, desc.Size)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("generating Merkle tree for %q: %w", path, err)
+		}
+
+	case unix.S_IFDIR:
+		dirents, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var ents []merkletree.DirEntry
+		for _, dirent := range dirents {
+			if merkletree.IsTreeFileName(dirent.Name()) {
+				continue
+			}
+			digest, err := measureVerity(filepath.Join(path, dirent.Name()), filepath.Join(path, merkletree.TreeFileName(dirent.Name())))
+			if err != nil {
+				return nil, err
+			}
+			ents = append(ents, merkletree.DirEntry{Name: dirent.Name(), Digest: digest})
+		}
+		payload = merkletree.EncodeDirectory(ents)
+
+	case unix.S_IFLNK:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		payload = []byte(target)
+	}
+
+	if desc.Root == nil {
+		// The payload of directories and symlinks is the data covered by their
+		// Merkle tree.
+		desc.Size = int64(len(payload))
+		_, root, err := merkletree.Generate(bytes.NewReader(payload), desc.Size)
+		if err != nil {
+			return nil, err
+		}
+		desc.Root = root
+	}
+
+	// Tree files are read-only, so replace rather than overwrite them.
+	if err := os.Remove(treePath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.WriteFile(treePath, append(desc.Encode(), payload...), 0444); err != nil {
+		return nil, err
+	}
+	return desc.Digest(), nil
+}
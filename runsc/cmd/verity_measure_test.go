@@ -0,0 +1,99 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/merkletree"
+)
+
+func readTreeFile(t *testing.T, path string) (merkletree.Descriptor, []byte) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading tree file: %v", err)
+	}
+	desc, err := merkletree.DecodeDescriptor(b)
+	if err != nil {
+		t.Fatalf("decoding descriptor of %q: %v", path, err)
+	}
+	return desc, b[merkletree.DescriptorSize:]
+}
+
+func TestVerityMeasure(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("verity"), 10000)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "file"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/file", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	rootHash, err := measureVerity(dir, filepath.Join(dir, merkletree.TreeFileName("")))
+	if err != nil {
+		t.Fatalf("measureVerity failed: %v", err)
+	}
+
+	// The root hash authenticates the root directory's listing, which in turn
+	// authenticates each of its children.
+	rootDesc, listing := readTreeFile(t, filepath.Join(dir, merkletree.TreeFileName("")))
+	if !bytes.Equal(rootDesc.Digest(), rootHash) {
+		t.Fatalf("root descriptor digest doesn't match the root hash")
+	}
+	ents, err := merkletree.DecodeDirectory(listing)
+	if err != nil {
+		t.Fatalf("decoding root listing: %v", err)
+	}
+	if len(ents) != 2 || ents[0].Name != "link" || ents[1].Name != "sub" {
+		t.Fatalf("root listing = %+v, want entries for link and sub", ents)
+	}
+
+	linkDesc, target := readTreeFile(t, filepath.Join(dir, merkletree.TreeFileName("link")))
+	if !bytes.Equal(linkDesc.Digest(), ents[0].Digest) {
+		t.Errorf("link descriptor digest doesn't match the root listing")
+	}
+	if string(target) != "sub/file" {
+		t.Errorf("link target = %q, want %q", target, "sub/file")
+	}
+
+	fileDesc, tree := readTreeFile(t, filepath.Join(dir, "sub", merkletree.TreeFileName("file")))
+	if fileDesc.Size != int64(len(data)) {
+		t.Errorf("file size = %d, want %d", fileDesc.Size, len(data))
+	}
+	l := merkletree.NewLayout(fileDesc.Size)
+	if err := merkletree.VerifyTree(l, tree, fileDesc.Root); err != nil {
+		t.Errorf("VerifyTree failed: %v", err)
+	}
+	if err := merkletree.VerifyData(l, tree, 0, data); err != nil {
+		t.Errorf("VerifyData failed: %v", err)
+	}
+
+	// Measuring again replaces the tree files and gives the same root hash.
+	again, err := measureVerity(dir, filepath.Join(dir, merkletree.TreeFileName("")))
+	if err != nil {
+		t.Fatalf("measureVerity failed: %v", err)
+	}
+	if !bytes.Equal(again, rootHash) {
+		t.Errorf("root hash changed when measuring again")
+	}
+}
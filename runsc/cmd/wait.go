@@ -17,24 +17,34 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/google/subcommands"
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/cmd/util"
 	"gvisor.dev/gvisor/runsc/config"
-	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/lib"
 )
 
 const (
 	unsetPID = -1
+
+	// waitTimeoutExitStatus is the exit status of "runsc wait" when the
+	// timeout expires before the process exits. It matches timeout(1).
+	waitTimeoutExitStatus = 124
 )
 
 // Wait implements subcommands.Command for the "wait" command.
 type Wait struct {
 	rootPID int
 	pid     int
+	timeout time.Duration
+	format  string
 }
 
 // Name implements subcommands.Command.Name.
@@ -56,6 +66,8 @@ func (*Wait) Usage() string {
 func (wt *Wait) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&wt.rootPID, "rootpid", unsetPID, "select a PID in the sandbox root PID namespace to wait on instead of the container's root process")
 	f.IntVar(&wt.pid, "pid", unsetPID, "select a PID in the container's PID namespace to wait on instead of the container's root process")
+	f.DurationVar(&wt.timeout, "timeout", 0, fmt.Sprintf("maximum time to wait for the process to exit, 0 means no timeout. If the timeout expires, runsc exits with status %d", waitTimeoutExitStatus))
+	f.StringVar(&wt.format, "format", "json", "output format: 'json' (default) or 'text'")
 }
 
 // Execute implements subcommands.Command.Execute. It waits for a process in a
@@ -70,41 +82,64 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		util.Fatalf("only one of -pid and -rootPid can be set")
 	}
 
+	if wt.format != "json" && wt.format != "text" {
+		util.Fatalf("unknown wait format %q", wt.format)
+	}
+
 	id := f.Arg(0)
 	conf := args[0].(*config.Config)
+	waitStatus := args[1].(*unix.WaitStatus)
 
-	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	c, err := lib.Load(conf, id)
 	if err != nil {
 		util.Fatalf("loading container: %v", err)
 	}
 
-	var waitStatus unix.WaitStatus
+	var (
+		ws   unix.WaitStatus
+		what string
+	)
 	switch {
 	// Wait on the whole container.
 	case wt.rootPID == unsetPID && wt.pid == unsetPID:
-		ws, err := c.Wait()
-		if err != nil {
-			util.Fatalf("waiting on container %q: %v", c.ID, err)
-		}
-		waitStatus = ws
+		ws, err = c.Wait(wt.timeout)
+		what = fmt.Sprintf("container %q", c.ID())
 	// Wait on a PID in the root PID namespace.
 	case wt.rootPID != unsetPID:
-		ws, err := c.WaitRootPID(int32(wt.rootPID))
-		if err != nil {
-			util.Fatalf("waiting on PID in root PID namespace %d in container %q: %v", wt.rootPID, c.ID, err)
-		}
-		waitStatus = ws
+		ws, err = c.WaitRootPID(int32(wt.rootPID), wt.timeout)
+		what = fmt.Sprintf("PID in root PID namespace %d in container %q", wt.rootPID, c.ID())
 	// Wait on a PID in the container's PID namespace.
 	case wt.pid != unsetPID:
-		ws, err := c.WaitPID(int32(wt.pid))
-		if err != nil {
-			util.Fatalf("waiting on PID %d in container %q: %v", wt.pid, c.ID, err)
+		ws, err = c.WaitPID(int32(wt.pid), wt.timeout)
+		what = fmt.Sprintf("PID %d in container %q", wt.pid, c.ID())
+	}
+	if errors.Is(err, boot.ErrWaitTimeout) {
+		msg := fmt.Sprintf("waiting on %s: %v", what, err)
+		if wt.format == "json" {
+			result := waitError{
+				ID:    id,
+				Error: msg,
+			}
+			if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+				util.Fatalf("marshaling wait error: %v", err)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, msg)
 		}
-		waitStatus = ws
+		*waitStatus = unix.WaitStatus(waitTimeoutExitStatus << 8)
+		return subcommands.ExitSuccess
+	}
+	if err != nil {
+		util.Fatalf("waiting on %s: %v", what, err)
+	}
+
+	if wt.format == "text" {
+		fmt.Println(exitStatus(ws))
+		return subcommands.ExitSuccess
 	}
 	result := waitResult{
 		ID:         id,
-		ExitStatus: exitStatus(waitStatus),
+		ExitStatus: exitStatus(ws),
 	}
 	// Write json-encoded wait result directly to stdout.
 	if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
@@ -118,6 +153,11 @@ type waitResult struct {
 	ExitStatus int    `json:"exitStatus"`
 }
 
+type waitError struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
 // exitStatus returns the correct exit status for a process based on if it
 // was signaled or exited cleanly.
 func exitStatus(status unix.WaitStatus) int {
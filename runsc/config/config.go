@@ -19,7 +19,13 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
 )
@@ -67,6 +73,11 @@ type Config struct {
 	// DebugLogFormat is the log format for debug.
 	DebugLogFormat string `flag:"debug-log-format"`
 
+	// LogRingSize is the number of recent sentry log statements kept in
+	// memory for runsc debug --dump-logs and --follow-logs. Zero disables
+	// the ring buffer.
+	LogRingSize int `flag:"log-ring-size"`
+
 	// FileAccess indicates how the root filesystem is accessed.
 	FileAccess FileAccessType `flag:"file-access"`
 
@@ -76,6 +87,10 @@ type Config struct {
 	// Overlay is whether to wrap the root filesystem in an overlay.
 	Overlay bool `flag:"overlay"`
 
+	// Overlay2 holds configuration about wrapping mounts in overlayfs.
+	// DO NOT call it directly, use GetOverlay2() instead.
+	Overlay2 Overlay2 `flag:"overlay2"`
+
 	// FSGoferHostUDS is deprecated: use host-uds=all.
 	FSGoferHostUDS bool `flag:"fsgofer-host-uds"`
 
@@ -86,9 +101,28 @@ type Config struct {
 	// HostFifo controls permission to access host FIFO (or named pipes).
 	HostFifo HostFifo `flag:"host-fifo"`
 
+	// HostAbstractSockets is a comma-separated list of abstract Unix socket
+	// names that are forwarded to the host's abstract socket namespace, unless
+	// a socket in the sandbox is bound to them.
+	HostAbstractSockets string `flag:"host-abstract-sockets"`
+
+	// HostProcSysMounts allows bind mounts whose source is in the host's /proc
+	// or /sys to be passed through to the sandbox. They are always mounted
+	// read-only.
+	HostProcSysMounts bool `flag:"host-proc-sys-mounts"`
+
 	// Network indicates what type of network to use.
 	Network NetworkType `flag:"network"`
 
+	// DHCPTimeout is the time for which the sandbox waits for a DHCP lease
+	// for each interface at boot with --network=dhcp.
+	DHCPTimeout time.Duration `flag:"dhcp-timeout"`
+
+	// DHCPResolvConf, with --network=dhcp, replaces /etc/resolv.conf in
+	// containers with one listing the DNS servers and domain names leased by
+	// DHCP.
+	DHCPResolvConf bool `flag:"dhcp-resolv-conf"`
+
 	// EnableRaw indicates whether raw sockets should be enabled. Raw
 	// sockets are disabled by stripping CAP_NET_RAW from the list of
 	// capabilities.
@@ -157,6 +191,19 @@ type Config struct {
 	// WatchdogAction sets what action the watchdog takes when triggered.
 	WatchdogAction watchdog.Action `flag:"watchdog-action"`
 
+	// OOMPolicy sets what happens when the sandbox runs out of memory.
+	OOMPolicy OOMPolicy `flag:"oom-policy"`
+
+	// SwapDir, if set, is a host directory in which a swap file of SwapSize
+	// bytes is created. When the sandbox reaches its memory limit, memory
+	// that hasn't been used recently is written to the swap file before
+	// the OOM killer kills anything. Requires OOMPolicy to be
+	// OOMPolicyKill.
+	SwapDir string `flag:"swap-dir"`
+
+	// SwapSize is the size in bytes of the swap file created in SwapDir.
+	SwapSize uint64 `flag:"swap-size"`
+
 	// PanicSignal registers signal handling that panics. Usually set to
 	// SIGUSR2(12) to troubleshoot hangs. -1 disables it.
 	PanicSignal int `flag:"panic-signal"`
@@ -180,18 +227,76 @@ type Config struct {
 	// duration of the container execution. Requires ProfileEnabled.
 	ProfileMutex string `flag:"profile-mutex"`
 
+	// CoreDumpDir is the host directory to which core dumps of sandboxed
+	// processes are written. If empty, core dumps are disabled.
+	CoreDumpDir string `flag:"core-dump-dir"`
+
 	// TraceFile collects a Go runtime execution trace to the passed file
 	// for the duration of the container execution.
 	TraceFile string `flag:"trace"`
 
+	// MetricServer makes the sandbox serve its metrics in the Prometheus text
+	// exposition format on a unix domain socket in the root directory.
+	MetricServer bool `flag:"metric-server"`
+
+	// SyscallLatencyMetric makes the sentry record a latency histogram of each
+	// syscall in sandbox metrics.
+	SyscallLatencyMetric bool `flag:"syscall-latency-metric"`
+
+	// VirtualTime makes the sandbox's clocks virtual: they start at the host's
+	// realtime but stand still until advanced with "runsc debug
+	// --advance-time", and timers only fire when time is advanced past their
+	// deadlines. This makes time-dependent behavior reproducible.
+	VirtualTime bool `flag:"virtual-time"`
+
+	// VirtualTimeQuantum, with VirtualTime, is the amount by which virtual
+	// time advances every time the application reads it. 0 means that time
+	// only advances when told to.
+	VirtualTimeQuantum time.Duration `flag:"virtual-time-quantum"`
+
 	// RestoreFile is the path to the saved container image.
 	RestoreFile string
 
-	// NumNetworkChannels controls the number of AF_PACKET sockets that map
-	// to the same underlying network device. This allows netstack to better
-	// scale for high throughput use cases.
+	// RestorePagesFile is the path to the contents of memory saved alongside
+	// RestoreFile, if any.
+	RestorePagesFile string
+
+	// RestoreLazyPages loads the contents of memory from RestorePagesFile on
+	// demand, rather than before the container is restored.
+	RestoreLazyPages bool
+
+	// RestoreEncryptionKey is the key that the saved container image was
+	// encrypted with, if any.
+	RestoreEncryptionKey []byte
+
+	// NumNetworkChannels controls the number of AF_PACKET sockets, or queues
+	// of multi-queue TAP devices, that map to the same underlying network
+	// device. This allows netstack to better scale for high throughput use
+	// cases.
 	NumNetworkChannels int `flag:"num-network-channels"`
 
+	// NetmaskRewrite is a comma-separated list of old=new subnet pairs. When
+	// restoring, the local addresses of sockets in an old subnet are rewritten
+	// to the address with the same host bits in the new subnet, so that their
+	// connections survive a change of network prefix.
+	NetmaskRewrite string `flag:"netmask-rewrite"`
+
+	// ConnectPolicySocket is the path of a unix domain socket of a policy
+	// server that decides whether outbound TCP connections from the sandbox
+	// are allowed, denied or redirected. If empty, all connections are
+	// allowed. See runsc/boot/connectpolicy/connect_policy.proto.
+	ConnectPolicySocket string `flag:"connect-policy-socket"`
+
+	// VsockCID is the AF_VSOCK context ID of the sandbox. If 0, AF_VSOCK
+	// sockets aren't supported.
+	VsockCID uint64 `flag:"vsock-cid"`
+
+	// VsockUDS is the path of the host unix domain socket carrying vsock
+	// connections, following Firecracker's convention: the host connects to
+	// the socket at this path to reach a port in the sandbox, and the sandbox
+	// connects to the socket at <path>_<port> to reach a port on the host.
+	VsockUDS string `flag:"vsock-uds"`
+
 	// Rootless allows the sandbox to be started with a user that is not root.
 	// Defense in depth measures are weaker in rootless mode. Specifically, the
 	// sandbox and Gofer process run as root inside a user namespace with root
@@ -214,9 +319,69 @@ type Config struct {
 	// Enable lisafs.
 	Lisafs bool `flag:"lisafs"`
 
+	// DirectFS makes the gofer donate host FDs for read-only gofer mounts to
+	// the sentry, which then accesses those files directly. Requires lisafs.
+	DirectFS bool `flag:"directfs"`
+
+	// GoferXattrs makes the gofer pass extended attributes in the "user" and
+	// "trusted" namespaces and file capabilities through to the host. The
+	// latter two are stored as "user.gvisor.*" host attributes. Requires
+	// lisafs.
+	GoferXattrs bool `flag:"gofer-xattrs"`
+
+	// GoferWriteback makes the sentry cache writes to files on exclusive gofer
+	// mounts and write them back to the gofer asynchronously. Mounts that are
+	// shared aren't affected.
+	GoferWriteback bool `flag:"gofer-writeback"`
+
+	// GoferDirtyBytes is the amount of dirty data that a gofer mount using
+	// write-back caching may hold before it is written back. 0 uses the
+	// default limit.
+	GoferDirtyBytes uint64 `flag:"gofer-dirty-bytes"`
+
+	// GoferDirtyExpire is the time for which data written to a gofer mount
+	// using write-back caching may remain dirty. 0 uses the default.
+	GoferDirtyExpire time.Duration `flag:"gofer-dirty-expire"`
+
+	// GoferReadaheadBytes is the amount of data that each gofer mount may
+	// read ahead of sequential readers. 0 uses the default limit. If
+	// negative, readahead is disabled.
+	GoferReadaheadBytes int `flag:"gofer-readahead-bytes"`
+
+	// FSGoferSlowOpThreshold makes the sentry log RPCs to the gofer that take
+	// longer than the threshold. 0 disables logging.
+	FSGoferSlowOpThreshold time.Duration `flag:"fsgofer-slow-op-threshold"`
+
+	// GoferReconnectTimeout makes the sandbox survive the death of a gofer:
+	// filesystem operations wait for up to this long for the gofer to be
+	// recovered with "runsc recover-gofer". 0 disables recovery, and the
+	// container is killed when its gofer dies. Requires lisafs.
+	GoferReconnectTimeout time.Duration `flag:"gofer-reconnect-timeout"`
+
 	// Enables FUSE usage.
 	FUSE bool `flag:"fuse"`
 
+	// MemfdSecret enables the memfd_secret(2) syscall.
+	MemfdSecret bool `flag:"memfd-secret"`
+
+	// RSeq enables restartable sequences (rseq(2)).
+	RSeq bool `flag:"rseq"`
+
+	// HostCPUAffinity backs each application CPU by one of the host CPUs
+	// that the sandbox is allowed to run on, and applies application CPU
+	// affinity to the host threads executing application code.
+	HostCPUAffinity bool `flag:"host-cpu-affinity"`
+
+	// NUMANodes is a list of host NUMA nodes, e.g. "0-1,3", that application
+	// memory is bound to. If empty, memory is placed by the host's default
+	// policy.
+	NUMANodes string `flag:"numa-nodes"`
+
+	// NUMATopology presents one synthetic NUMA node to the application for
+	// each host node in NUMANodes, and places memory allocated on each
+	// synthetic node on the corresponding host node.
+	NUMATopology bool `flag:"numa-topology"`
+
 	// Allows overriding of flags in OCI annotations.
 	AllowFlagOverride bool `flag:"allow-flag-override"`
 
@@ -236,6 +401,14 @@ type Config struct {
 	// take during pod creation.
 	PodInitConfig string `flag:"pod-init-config"`
 
+	// CompatTracking enables counting every unimplemented syscall invoked in
+	// the sandbox, which is reported by "runsc debug --compat-report".
+	CompatTracking bool `flag:"compat-tracking"`
+
+	// CompatPolicy is the path to a JSON file listing unimplemented syscalls
+	// that kill the calling process with SIGSYS. See boot.CompatPolicy.
+	CompatPolicy string `flag:"compat-policy"`
+
 	// Use pools to manage buffer memory instead of heap.
 	BufferPooling bool `flag:"buffer-pooling"`
 
@@ -252,6 +425,15 @@ type Config struct {
 	// used.
 	DCache int `flag:"dcache"`
 
+	// MaxDentriesPerMount is the size of each per-mount dentry cache, used if
+	// DCache is negative.
+	MaxDentriesPerMount int `flag:"max-dentries-per-mount"`
+
+	// MaxCachedFileBytes limits the regular file data cached by all gofer
+	// mounts in bytes. If zero, cached file data is only limited by memory
+	// pressure.
+	MaxCachedFileBytes uint64 `flag:"max-cached-file-bytes"`
+
 	// TestOnlyAllowRunAsCurrentUserWithoutChroot should only be used in
 	// tests. It allows runsc to start the sandbox process as the current
 	// user, and without chrooting the sandbox process. This can be
@@ -271,9 +453,61 @@ func (c *Config) validate() error {
 	if c.FileAccess == FileAccessShared && c.Overlay {
 		return fmt.Errorf("overlay flag is incompatible with shared file access")
 	}
+	if c.Overlay && c.Overlay2.Enabled() {
+		return fmt.Errorf("overlay flag is incompatible with overlay2 flag")
+	}
+	if c.FileAccess == FileAccessShared && c.Overlay2.RootMount {
+		return fmt.Errorf("overlay2 flag is incompatible with shared file access for the root mount")
+	}
+	if c.Overlay2.IsBackedByHostDir() && !c.Lisafs {
+		return fmt.Errorf("overlay2 flag with a host directory medium requires lisafs")
+	}
+	if c.GoferXattrs && !c.Lisafs {
+		return fmt.Errorf("gofer-xattrs flag requires lisafs")
+	}
+	if c.FSGoferSlowOpThreshold < 0 {
+		return fmt.Errorf("fsgofer-slow-op-threshold must be >= 0, got: %v", c.FSGoferSlowOpThreshold)
+	}
+	if c.GoferReconnectTimeout < 0 {
+		return fmt.Errorf("gofer-reconnect-timeout must be >= 0, got: %v", c.GoferReconnectTimeout)
+	}
+	if c.GoferReconnectTimeout > 0 && !c.Lisafs {
+		return fmt.Errorf("gofer-reconnect-timeout flag requires lisafs")
+	}
+	if c.VirtualTimeQuantum < 0 {
+		return fmt.Errorf("virtual-time-quantum must be >= 0, got: %v", c.VirtualTimeQuantum)
+	}
+	if c.VirtualTimeQuantum > 0 && !c.VirtualTime {
+		return fmt.Errorf("virtual-time-quantum flag requires virtual-time")
+	}
+	nodes, err := c.HostNUMANodes()
+	if err != nil {
+		return err
+	}
+	if c.NUMATopology && len(nodes) == 0 {
+		return fmt.Errorf("numa-topology flag requires numa-nodes flag")
+	}
+	if c.NUMATopology && len(nodes) > 64 {
+		return fmt.Errorf("numa-topology flag supports at most 64 nodes, got: %d", len(nodes))
+	}
+	if c.Network == NetworkDHCP && c.DHCPTimeout <= 0 {
+		return fmt.Errorf("dhcp-timeout must be > 0, got: %v", c.DHCPTimeout)
+	}
+	if c.Network == NetworkDHCP && c.AFXDP {
+		return fmt.Errorf("network=dhcp is incompatible with AF_XDP")
+	}
+	if c.DHCPResolvConf && c.Network != NetworkDHCP {
+		return fmt.Errorf("dhcp-resolv-conf flag requires network=dhcp")
+	}
 	if c.NumNetworkChannels <= 0 {
 		return fmt.Errorf("num_network_channels must be > 0, got: %d", c.NumNetworkChannels)
 	}
+	if c.SwapDir != "" && c.SwapSize == 0 {
+		return fmt.Errorf("swap-dir flag requires swap-size flag")
+	}
+	if c.SwapDir != "" && c.OOMPolicy != OOMPolicyKill {
+		return fmt.Errorf("swap-dir flag requires oom-policy=kill")
+	}
 	// Require profile flags to explicitly opt-in to profiling with
 	// -profile rather than implying it since these options have security
 	// implications.
@@ -289,6 +523,25 @@ func (c *Config) validate() error {
 	if c.ProfileMutex != "" && !c.ProfileEnable {
 		return fmt.Errorf("profile-mutex flag requires enabling profiling with profile flag")
 	}
+	if c.VsockCID != 0 {
+		if c.VsockCID <= linux.VMADDR_CID_HOST || c.VsockCID >= linux.VMADDR_CID_ANY {
+			return fmt.Errorf("vsock-cid must be between %d and %d, got: %d", linux.VMADDR_CID_HOST+1, linux.VMADDR_CID_ANY-1, c.VsockCID)
+		}
+		// Connections can't be carried over /dev/vhost-vsock, which
+		// requires emulating a virtio device, so a unix domain socket is
+		// always needed.
+		if c.VsockUDS == "" {
+			return fmt.Errorf("vsock-cid flag requires vsock-uds flag")
+		}
+	}
+	if c.VsockUDS != "" {
+		if c.VsockCID == 0 {
+			return fmt.Errorf("vsock-uds flag requires vsock-cid flag")
+		}
+		if !filepath.IsAbs(c.VsockUDS) {
+			return fmt.Errorf("vsock-uds must be an absolute path, got: %q", c.VsockUDS)
+		}
+	}
 	if c.FSGoferHostUDS && c.HostUDS != HostUDSNone {
 		// Deprecated flag was used together with flag that replaced it.
 		return fmt.Errorf("fsgofer-host-uds has been replaced with host-uds flag")
@@ -309,6 +562,51 @@ func (c *Config) GetHostUDS() HostUDS {
 	return c.HostUDS
 }
 
+// HostNUMANodes returns the sorted list of host NUMA nodes given by the
+// numa-nodes flag.
+func (c *Config) HostNUMANodes() ([]int, error) {
+	if c.NUMANodes == "" {
+		return nil, nil
+	}
+	seen := make(map[int]struct{})
+	for _, r := range strings.Split(c.NUMANodes, ",") {
+		first, last := r, r
+		if i := strings.IndexByte(r, '-'); i >= 0 {
+			first, last = r[:i], r[i+1:]
+		}
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid numa-nodes %q: bad node %q", c.NUMANodes, first)
+		}
+		end, err := strconv.Atoi(last)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid numa-nodes %q: bad range %q", c.NUMANodes, r)
+		}
+		for node := start; node <= end; node++ {
+			seen[node] = struct{}{}
+		}
+	}
+	nodes := make([]int, 0, len(seen))
+	for node := range seen {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+	return nodes, nil
+}
+
+// GetOverlay2 returns the overlay configuration, taking into consideration
+// all flags that affect the result.
+func (c *Config) GetOverlay2() Overlay2 {
+	if c.Overlay {
+		if c.Overlay2.Enabled() {
+			panic(fmt.Sprintf("Overlay2 cannot be set when --overlay=true"))
+		}
+		// --overlay is equivalent to --overlay2=all:memory.
+		return Overlay2{RootMount: true, SubMounts: true, Medium: overlay2MediumMemory}
+	}
+	return c.Overlay2
+}
+
 // FileAccessType tells how the filesystem is accessed.
 type FileAccessType int
 
@@ -374,6 +672,11 @@ const (
 
 	// NetworkNone sets up just loopback using netstack.
 	NetworkNone
+
+	// NetworkDHCP uses the internal network stack like NetworkSandbox, but
+	// the addresses, routes and DNS servers of interfaces are leased with
+	// DHCP instead of being copied from the host.
+	NetworkDHCP
 )
 
 func networkTypePtr(v NetworkType) *NetworkType {
@@ -389,6 +692,8 @@ func (n *NetworkType) Set(v string) error {
 		*n = NetworkHost
 	case "none":
 		*n = NetworkNone
+	case "dhcp":
+		*n = NetworkDHCP
 	default:
 		return fmt.Errorf("invalid network type %q", v)
 	}
@@ -409,6 +714,8 @@ func (n NetworkType) String() string {
 		return "host"
 	case NetworkNone:
 		return "none"
+	case NetworkDHCP:
+		return "dhcp"
 	}
 	panic(fmt.Sprintf("Invalid network type %d", n))
 }
@@ -586,3 +893,149 @@ func (g HostFifo) String() string {
 func (g HostFifo) AllowOpen() bool {
 	return g&HostFifoOpen != 0
 }
+
+// OOMPolicy tells what happens when the sandbox exhausts its memory limit.
+type OOMPolicy int
+
+const (
+	// OOMPolicyPanic leaves memory limits to the host, which typically kills
+	// the whole sandbox when it runs out of memory.
+	OOMPolicyPanic OOMPolicy = iota
+
+	// OOMPolicyKill limits the memory allocated by the sentry to the sandbox's
+	// total memory and, when the limit is reached, kills the process selected
+	// by the sentry's OOM killer using its memory usage and oom_score_adj.
+	OOMPolicyKill
+)
+
+func oomPolicyPtr(v OOMPolicy) *OOMPolicy {
+	return &v
+}
+
+// Set implements flag.Value.
+func (p *OOMPolicy) Set(v string) error {
+	switch v {
+	case "", "panic":
+		*p = OOMPolicyPanic
+	case "kill":
+		*p = OOMPolicyKill
+	default:
+		return fmt.Errorf("invalid OOM policy %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (p *OOMPolicy) Get() interface{} {
+	return *p
+}
+
+// String implements flag.Value.
+func (p OOMPolicy) String() string {
+	switch p {
+	case OOMPolicyPanic:
+		return "panic"
+	case OOMPolicyKill:
+		return "kill"
+	}
+	panic(fmt.Sprintf("Invalid OOM policy %d", p))
+}
+
+const (
+	// overlay2MediumMemory stores the upper layer of overlays in memory.
+	overlay2MediumMemory = "memory"
+
+	// overlay2MediumDirPrefix prefixes the host directory that stores the
+	// upper layer of the root overlay.
+	overlay2MediumDirPrefix = "dir="
+)
+
+// Overlay2 holds the configuration for setting up overlay filesystems for the
+// container. It is set with a flag of the form "{none|root|all}:<medium>",
+// where medium is "memory" for an upper layer kept in memory inside the
+// sandbox, or "dir=<path>" for an upper layer stored in a host directory.
+// Host directories can only back the root mount.
+type Overlay2 struct {
+	// RootMount is whether the root mount is wrapped in an overlay.
+	RootMount bool
+
+	// SubMounts is whether gofer-backed submounts are wrapped in an overlay.
+	SubMounts bool
+
+	// Medium is where the upper layers of overlays are stored.
+	Medium string
+}
+
+func overlay2Ptr(v Overlay2) *Overlay2 {
+	return &v
+}
+
+// Set implements flag.Value.
+func (o *Overlay2) Set(v string) error {
+	if v == "" || v == "none" {
+		*o = Overlay2{}
+		return nil
+	}
+	parts := strings.SplitN(v, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid overlay2 %q, must be of the form {none|root|all}:<medium>", v)
+	}
+	var res Overlay2
+	switch parts[0] {
+	case "root":
+		res.RootMount = true
+	case "all":
+		res.RootMount = true
+		res.SubMounts = true
+	default:
+		return fmt.Errorf("invalid overlay2 mount specifier %q, must be one of: root, all", parts[0])
+	}
+	res.Medium = parts[1]
+	switch {
+	case res.Medium == overlay2MediumMemory:
+	case strings.HasPrefix(res.Medium, overlay2MediumDirPrefix):
+		if res.SubMounts {
+			return fmt.Errorf("invalid overlay2 %q, a host directory can only back the root mount", v)
+		}
+		if dir := res.HostDir(); !filepath.IsAbs(dir) {
+			return fmt.Errorf("invalid overlay2 host directory %q, must be an absolute path", dir)
+		}
+	default:
+		return fmt.Errorf("invalid overlay2 medium %q, must be one of: memory, dir=<path>", res.Medium)
+	}
+	*o = res
+	return nil
+}
+
+// Get implements flag.Value.
+func (o *Overlay2) Get() interface{} {
+	return *o
+}
+
+// String implements flag.Value.
+func (o Overlay2) String() string {
+	if !o.Enabled() {
+		return "none"
+	}
+	if o.SubMounts {
+		return "all:" + o.Medium
+	}
+	return "root:" + o.Medium
+}
+
+// Enabled returns true if any mount is wrapped in an overlay.
+func (o Overlay2) Enabled() bool {
+	return o.RootMount || o.SubMounts
+}
+
+// IsBackedByHostDir returns true if the upper layer of the root overlay is
+// stored in a host directory.
+func (o Overlay2) IsBackedByHostDir() bool {
+	return o.RootMount && strings.HasPrefix(o.Medium, overlay2MediumDirPrefix)
+}
+
+// HostDir returns the host directory that stores the upper layer of the root
+// overlay. It is only valid if IsBackedByHostDir() returns true.
+func (o Overlay2) HostDir() string {
+	return strings.TrimPrefix(o.Medium, overlay2MediumDirPrefix)
+}
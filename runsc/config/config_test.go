@@ -145,6 +145,10 @@ func TestInvalidFlags(t *testing.T) {
 			name:  "host-fifo",
 			error: "invalid host fifo",
 		},
+		{
+			name:  "overlay2",
+			error: "invalid overlay2",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
@@ -156,6 +160,45 @@ func TestInvalidFlags(t *testing.T) {
 	}
 }
 
+func TestOverlay2(t *testing.T) {
+	for _, tc := range []struct {
+		val  string
+		want Overlay2
+		str  string
+		err  string
+	}{
+		{val: "none", want: Overlay2{}, str: "none"},
+		{val: "root:memory", want: Overlay2{RootMount: true, Medium: "memory"}, str: "root:memory"},
+		{val: "all:memory", want: Overlay2{RootMount: true, SubMounts: true, Medium: "memory"}, str: "all:memory"},
+		{val: "root:dir=/upper", want: Overlay2{RootMount: true, Medium: "dir=/upper"}, str: "root:dir=/upper"},
+		{val: "all:dir=/upper", err: "can only back the root mount"},
+		{val: "root:dir=upper", err: "must be an absolute path"},
+		{val: "root:disk", err: "invalid overlay2 medium"},
+		{val: "some:memory", err: "invalid overlay2 mount specifier"},
+		{val: "root", err: "must be of the form"},
+	} {
+		t.Run(tc.val, func(t *testing.T) {
+			var o Overlay2
+			err := o.Set(tc.val)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Set(%q) wrong error reported: %v", tc.val, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set(%q): %v", tc.val, err)
+			}
+			if o != tc.want {
+				t.Errorf("Set(%q) = %+v, want: %+v", tc.val, o, tc.want)
+			}
+			if got := o.String(); got != tc.str {
+				t.Errorf("String() = %q, want: %q", got, tc.str)
+			}
+		})
+	}
+}
+
 func TestValidationFail(t *testing.T) {
 	for _, tc := range []struct {
 		name  string
@@ -170,6 +213,22 @@ func TestValidationFail(t *testing.T) {
 			},
 			error: "overlay flag is incompatible",
 		},
+		{
+			name: "overlay+overlay2",
+			flags: map[string]string{
+				"overlay":  "true",
+				"overlay2": "root:memory",
+			},
+			error: "overlay flag is incompatible with overlay2 flag",
+		},
+		{
+			name: "overlay2-dir+9p",
+			flags: map[string]string{
+				"overlay2": "root:dir=/tmp",
+				"lisafs":   "false",
+			},
+			error: "requires lisafs",
+		},
 		{
 			name: "network-channels",
 			flags: map[string]string{
@@ -177,6 +236,52 @@ func TestValidationFail(t *testing.T) {
 			},
 			error: "num_network_channels must be > 0",
 		},
+		{
+			name: "swap-dir-without-size",
+			flags: map[string]string{
+				"swap-dir":   "/tmp",
+				"oom-policy": "kill",
+			},
+			error: "swap-dir flag requires swap-size flag",
+		},
+		{
+			name: "swap-dir+oom-policy:panic",
+			flags: map[string]string{
+				"swap-dir":  "/tmp",
+				"swap-size": "1048576",
+			},
+			error: "swap-dir flag requires oom-policy=kill",
+		},
+		{
+			name: "vsock-cid:host",
+			flags: map[string]string{
+				"vsock-cid": "2",
+				"vsock-uds": "/tmp/v.sock",
+			},
+			error: "vsock-cid must be between 3 and 4294967294",
+		},
+		{
+			name: "vsock-cid-without-uds",
+			flags: map[string]string{
+				"vsock-cid": "3",
+			},
+			error: "vsock-cid flag requires vsock-uds flag",
+		},
+		{
+			name: "vsock-uds-without-cid",
+			flags: map[string]string{
+				"vsock-uds": "/tmp/v.sock",
+			},
+			error: "vsock-uds flag requires vsock-cid flag",
+		},
+		{
+			name: "vsock-uds:relative",
+			flags: map[string]string{
+				"vsock-cid": "3",
+				"vsock-uds": "v.sock",
+			},
+			error: "vsock-uds must be an absolute path",
+		},
 		{
 			name: "fsgofer-host-uds+comm:open",
 			flags: map[string]string{
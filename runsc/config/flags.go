@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
@@ -47,6 +48,7 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("log-packets", false, "enable network packet logging.")
 	flagSet.String("pcap-log", "", "location of PCAP log file.")
 	flagSet.String("debug-log-format", "text", "log format: text (default), json, or json-k8s.")
+	flagSet.Int("log-ring-size", 4096, "number of recent sentry log statements kept in memory for 'runsc debug --dump-logs' and '--follow-logs'. 0 disables it.")
 	flagSet.Bool("alsologtostderr", false, "send log messages to stderr.")
 	flagSet.Bool("allow-flag-override", false, "allow OCI annotations (dev.gvisor.flag.<name>) to override flags for debugging.")
 	flagSet.String("traceback", "system", "golang runtime's traceback level")
@@ -60,39 +62,69 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	// Flags that control sandbox runtime behavior.
 	flagSet.String("platform", "ptrace", "specifies which platform to use: ptrace (default), kvm.")
 	flagSet.String("platform_device_path", "", "path to a platform-specific device file (e.g. /dev/kvm for KVM platform). If unset, will use a sane platform-specific default.")
-	flagSet.Var(watchdogActionPtr(watchdog.LogWarning), "watchdog-action", "sets what action the watchdog takes when triggered: log (default), panic.")
+	flagSet.Var(watchdogActionPtr(watchdog.LogWarning), "watchdog-action", "sets what action the watchdog takes when triggered: log (default), panic, or bundle,log and bundle,panic to first write a diagnostic bundle to the debug log directory.")
+	flagSet.Var(oomPolicyPtr(OOMPolicyPanic), "oom-policy", "sets what happens when the sandbox runs out of memory: panic (default) leaves it to the host, which usually kills the whole sandbox; kill limits sentry memory to the sandbox's total memory and kills the process with the highest OOM score, honoring oom_score_adj.")
+	flagSet.String("swap-dir", "", "host directory in which to create a swap file of --swap-size bytes. Memory that hasn't been used recently is swapped out when the sandbox reaches its memory limit, before the OOM killer kills anything. Requires --oom-policy=kill.")
+	flagSet.Uint64("swap-size", 0, "with --swap-dir, the size of the swap file in bytes.")
 	flagSet.Int("panic-signal", -1, "register signal handling that panics. Usually set to SIGUSR2(12) to troubleshoot hangs. -1 disables it.")
 	flagSet.Bool("profile", false, "prepares the sandbox to use Golang profiler. Note that enabling profiler loosens the seccomp protection added to the sandbox (DO NOT USE IN PRODUCTION).")
 	flagSet.String("profile-block", "", "collects a block profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("profile-cpu", "", "collects a CPU profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("profile-heap", "", "collects a heap profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("profile-mutex", "", "collects a mutex profile to this file path for the duration of the container execution. Requires -profile=true.")
+	flagSet.String("core-dump-dir", "", "host directory to which core dumps of sandboxed processes are written. Naming within the directory follows /proc/sys/kernel/core_pattern. If unset, core dumps are disabled.")
 	flagSet.String("trace", "", "collects a Go runtime execution trace to this file path for the duration of the container execution.")
+	flagSet.Bool("metric-server", false, "serve sandbox metrics in the Prometheus text exposition format on a unix domain socket in the root directory.")
+	flagSet.Bool("syscall-latency-metric", false, "record a latency histogram of each syscall executed by the sentry in sandbox metrics. This adds overhead to every syscall.")
+	flagSet.Bool("virtual-time", false, "makes the sandbox's clocks virtual: time stands still until advanced with 'runsc debug --advance-time', so that time-dependent behavior is reproducible.")
+	flagSet.Duration("virtual-time-quantum", 0, "with --virtual-time, advances virtual time by this duration, e.g. 1us, every time the application reads it, so that busy loops waiting for time to pass make progress. 0 disables it.")
 	flagSet.Bool("rootless", false, "it allows the sandbox to be started with a user that is not root. Sandbox and Gofer processes may run with same privileges as current user.")
 	flagSet.Var(leakModePtr(refs.NoLeakChecking), "ref-leak-mode", "sets reference leak check mode: disabled (default), log-names, log-traces.")
 	flagSet.Bool("cpu-num-from-quota", false, "set cpu number to cpu quota (least integer greater or equal to quota value, but not less than 2)")
 	flagSet.Bool("oci-seccomp", false, "Enables loading OCI seccomp filters inside the sandbox.")
 	flagSet.Bool("enable-core-tags", false, "enables core tagging. Requires host linux kernel >= 5.14.")
 	flagSet.String("pod-init-config", "", "path to configuration file with additional steps to take during pod creation.")
+	flagSet.Bool("compat-tracking", false, "count every unimplemented syscall invoked in the sandbox, see runsc debug --compat-report.")
+	flagSet.String("compat-policy", "", `path to a JSON file listing unimplemented syscalls that kill the calling process with SIGSYS, e.g. {"kill": [{"syscall": "ioctl", "args": [21505]}, {"syscall": "io_uring_setup"}]}.`)
 
 	// Flags that control sandbox runtime behavior: FS related.
 	flagSet.Var(fileAccessTypePtr(FileAccessExclusive), "file-access", "specifies which filesystem validation to use for the root mount: exclusive (default), shared.")
 	flagSet.Var(fileAccessTypePtr(FileAccessShared), "file-access-mounts", "specifies which filesystem validation to use for volumes other than the root mount: shared (default), exclusive.")
 	flagSet.Bool("overlay", false, "wrap filesystem mounts with writable overlay. All modifications are stored in memory inside the sandbox.")
+	flagSet.Var(overlay2Ptr(Overlay2{}), "overlay2", "wrap mounts with overlayfs. Format is {none|root|all}:{memory|dir=<path>}. With dir=<path>, modifications to the root mount are stored in a per-container subdirectory of the given host directory and persist across sandbox restarts.")
 	flagSet.Bool("fsgofer-host-uds", false, "DEPRECATED: use host-uds=all")
 	flagSet.Var(hostUDSPtr(HostUDSNone), "host-uds", "controls permission to access host Unix-domain sockets. Values: none|open|create|all, default: none")
 	flagSet.Var(hostFifoPtr(HostFifoNone), "host-fifo", "controls permission to access host FIFOs (or named pipes). Values: none|open, default: none")
+	flagSet.String("host-abstract-sockets", "", `comma-separated list of abstract Unix socket names (without the leading "@") that are connected to in the host's abstract socket namespace, e.g. for systemd notifications. Note that this loosens the seccomp protection added to the sandbox.`)
+	flagSet.Bool("host-proc-sys-mounts", false, "allows bind mounts from the host's /proc and /sys, e.g. /sys/fs/cgroup, to be passed through to the sandbox read-only. Paths such as /proc/self are resolved in the gofer's namespaces, not the container's.")
 
 	flagSet.Bool("vfs2", true, "DEPRECATED: this flag has no effect.")
 	flagSet.Bool("fuse", false, "TEST ONLY; use while FUSE in VFSv2 is landing. This allows the use of the new experimental FUSE filesystem.")
+	flagSet.Bool("rseq", false, "enables restartable sequences (rseq(2)), used by glibc and tcmalloc for per-CPU data. Tasks using rseq are scheduled on as many virtual CPUs as the sandbox has, which limits the parallelism of application code to the number of CPUs.")
+	flagSet.Bool("host-cpu-affinity", false, "backs each CPU of the sandbox by one of the host CPUs in its cpuset, and pins application threads to the host CPUs corresponding to their sched_setaffinity(2) masks. Each application thread gets a dedicated host thread. Only supported by the KVM platform; --cpu-num-from-quota is ignored.")
+	flagSet.String("numa-nodes", "", "list of host NUMA nodes to bind application memory to, e.g. \"0-1,3\".")
+	flagSet.Bool("numa-topology", false, "presents one NUMA node to the application for each host node in --numa-nodes, backed by that host node. Enables get_mempolicy(2), set_mempolicy(2) and mbind(2) placement across the nodes.")
+	flagSet.Bool("memfd-secret", false, "enables the memfd_secret(2) syscall. Pages mapped from secret memory files are excluded from checkpoints.")
 	flagSet.Bool("lisafs", true, "Enables lisafs protocol instead of 9P.")
+	flagSet.Bool("directfs", false, "EXPERIMENTAL: allows the sentry to access files of a read-only root filesystem directly using host FDs donated by the gofer, instead of making an RPC for each operation. Requires lisafs.")
+	flagSet.Bool("gofer-xattrs", false, "allows extended attributes in the user and trusted namespaces and file capabilities (security.capability) on gofer mounts. Attributes other than user.* are stored as user.gvisor.* attributes on the host. Requires lisafs.")
+	flagSet.Bool("gofer-writeback", false, "caches writes to files on exclusive gofer mounts in the sandbox and writes them back to the host asynchronously, which is faster for workloads making many small writes. Data that hasn't been synced may be lost if the sandbox crashes. Shared mounts aren't affected.")
+	flagSet.Uint64("gofer-dirty-bytes", 0, "with --gofer-writeback, the amount of dirty data (in bytes) that each mount may hold before it is written back. 0 uses the default of 64MiB.")
+	flagSet.Duration("gofer-dirty-expire", 0, "with --gofer-writeback, the time for which written data may remain dirty before it is written back, e.g. 5s. 0 uses the default of 30s.")
+	flagSet.Int("gofer-readahead-bytes", 0, "limit on the amount of data (in bytes) that each gofer mount may read ahead of applications reading files sequentially. 0 uses the default of 32MiB. A negative value disables readahead.")
+	flagSet.Duration("fsgofer-slow-op-threshold", 0, "logs RPCs to the gofer that take longer than this duration, e.g. 100ms, with their message type and request. Logging is rate limited. 0 disables it.")
+	flagSet.Duration("gofer-reconnect-timeout", 0, "allows the sandbox to survive the death of a gofer: filesystem operations wait up to this long, e.g. 30s, for the gofer to be restarted with 'runsc recover-gofer'. 0 kills the container when its gofer dies. Requires lisafs.")
 	flagSet.Bool("cgroupfs", false, "Automatically mount cgroupfs.")
 	flagSet.Bool("ignore-cgroups", false, "don't configure cgroups.")
 	flagSet.Int("fdlimit", -1, "Specifies a limit on the number of host file descriptors that can be open. Applies separately to the sentry and gofer. Note: each file in the sandbox holds more than one host FD open.")
 	flagSet.Int("dcache", -1, "Set the global dentry cache size. This acts as a coarse-grained control on the number of host FDs simultaneously open by the sentry. If negative, per-mount caches are used.")
+	flagSet.Int("max-dentries-per-mount", 1000, "Size of each per-mount dentry cache, used if --dcache is negative.")
+	flagSet.Uint64("max-cached-file-bytes", 0, "Limit on the amount of regular file data (in bytes) cached by all gofer mounts. Least recently used files are evicted first. 0 means unlimited, subject to memory pressure.")
 
 	// Flags that control sandbox runtime behavior: network related.
-	flagSet.Var(networkTypePtr(NetworkSandbox), "network", "specifies which network to use: sandbox (default), host, none. Using network inside the sandbox is more secure because it's isolated from the host network.")
+	flagSet.Var(networkTypePtr(NetworkSandbox), "network", "specifies which network to use: sandbox (default), host, none, dhcp. Using network inside the sandbox is more secure because it's isolated from the host network. dhcp is like sandbox, but leases the addresses, routes and DNS servers of interfaces with DHCP instead of copying them from the host.")
+	flagSet.Duration("dhcp-timeout", 30*time.Second, "with --network=dhcp, the time to wait for a DHCP lease for each interface at boot.")
+	flagSet.Bool("dhcp-resolv-conf", false, "with --network=dhcp, replaces /etc/resolv.conf in containers with the DNS servers and domain names leased by DHCP.")
 	flagSet.Bool("net-raw", false, "enable raw sockets. When false, raw sockets are disabled by removing CAP_NET_RAW from containers (`runsc exec` will still be able to utilize raw sockets). Raw sockets allow malicious containers to craft packets and potentially attack the network.")
 	flagSet.Bool("gso", true, "enable host segmentation offload if it is supported by a network device.")
 	flagSet.Bool("software-gso", true, "enable gVisor segmentation offload when host offload can't be enabled.")
@@ -100,6 +132,10 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("rx-checksum-offload", true, "enable RX checksum offload.")
 	flagSet.Var(queueingDisciplinePtr(QDiscFIFO), "qdisc", "specifies which queueing discipline to apply by default to the non loopback nics used by the sandbox.")
 	flagSet.Int("num-network-channels", 1, "number of underlying channels(FDs) to use for network link endpoints.")
+	flagSet.String("netmask-rewrite", "", "comma-separated list of old=new subnet pairs in CIDR notation, e.g. 10.0.0.0/24=10.1.0.0/24. On restore, socket addresses in an old subnet are rewritten to the same host in the new subnet, so that their connections are not reset.")
+	flagSet.String("connect-policy-socket", "", "path to a unix domain socket of a policy server that is asked whether outbound TCP connections are allowed, denied or redirected.")
+	flagSet.Uint64("vsock-cid", 0, "AF_VSOCK context ID of the sandbox, which must be greater than 2. 0 disables AF_VSOCK sockets.")
+	flagSet.String("vsock-uds", "", "with --vsock-cid, absolute path of a unix domain socket created by runsc to carry vsock connections from the host. The sandbox reaches port P on the host by connecting to <path>_P.")
 	flagSet.Bool("buffer-pooling", true, "enable allocation of buffers from a shared pool instead of the heap.")
 	flagSet.Bool("EXPERIMENTAL-afxdp", false, "EXPERIMENTAL. Use an AF_XDP socket to receive packets.")
 
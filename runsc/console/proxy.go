@@ -0,0 +1,249 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package console
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kr/pty"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultDetachKeys is the default detach key sequence, as used by Docker.
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// drainTimeout is how long Close waits for output that is still buffered in
+// the pty to be copied to the terminal.
+const drainTimeout = 100 * time.Millisecond
+
+// ParseDetachKeys parses a detach key sequence in the format used by Docker:
+// a comma-separated list of keys, each of which is either a single character
+// or "ctrl-<value>", where <value> is a letter or one of "@", "[", "\", "]",
+// "^" and "_". An empty sequence disables detaching.
+func ParseDetachKeys(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var keys []byte
+	for _, key := range strings.Split(s, ",") {
+		if len(key) == 1 {
+			keys = append(keys, key[0])
+			continue
+		}
+		if !strings.HasPrefix(key, "ctrl-") || len(key) != len("ctrl-")+1 {
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+		c := key[len(key)-1]
+		switch {
+		case c >= 'a' && c <= 'z':
+			keys = append(keys, c-'a'+1)
+		case c >= 'A' && c <= 'Z':
+			keys = append(keys, c-'A'+1)
+		case c >= '@' && c <= '_':
+			// '@' through '_' includes the letters handled above.
+			keys = append(keys, c-'@')
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+	}
+	return keys, nil
+}
+
+// detachScanner looks for a detach key sequence in a stream of input.
+type detachScanner struct {
+	keys []byte
+
+	// matched is the number of keys matched so far. These keys have been
+	// withheld from the output of scan.
+	matched int
+}
+
+// scan returns the part of in that should be passed on, and whether the
+// detach key sequence was completed. Keys that may be part of the sequence
+// are withheld until the sequence is either completed or broken.
+func (d *detachScanner) scan(in []byte) ([]byte, bool) {
+	if len(d.keys) == 0 {
+		return in, false
+	}
+	out := make([]byte, 0, len(in)+d.matched)
+	for _, c := range in {
+		if c == d.keys[d.matched] {
+			d.matched++
+			if d.matched == len(d.keys) {
+				return out, true
+			}
+			continue
+		}
+		// The sequence is broken: pass on the withheld keys. The current
+		// character may start a new sequence.
+		out = append(out, d.keys[:d.matched]...)
+		d.matched = 0
+		if c == d.keys[0] {
+			d.matched = 1
+			if len(d.keys) == 1 {
+				return out, true
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, false
+}
+
+// Proxy copies data between the terminal of the current process and the
+// master of a new pty, whose replica is used as the stdio of a process in the
+// sandbox.
+//
+// The replica is not the controlling terminal of any host process, so host
+// signals generated by the replica's line discipline would be lost. Instead,
+// the current terminal is put in raw mode with signal generation left
+// enabled, so that the current process receives signals generated by the
+// user and can forward them to the sandbox.
+type Proxy struct {
+	master     *os.File
+	detachKeys []byte
+
+	// termios is the state of the current terminal to restore on Close.
+	termios *unix.Termios
+
+	// detached is closed when the detach key sequence is read.
+	detached chan struct{}
+
+	// outputDone is closed once output stops being copied.
+	outputDone chan struct{}
+}
+
+// NewProxy creates a new pty master/replica pair and returns a proxy for the
+// master along with the replica, which the caller must close once it has been
+// passed to the sandbox. The proxy doesn't start copying data until Start is
+// called.
+func NewProxy(detachKeys []byte) (*Proxy, *os.File, error) {
+	if _, err := unix.IoctlGetTermios(int(os.Stdin.Fd()), unix.TCGETS); err != nil {
+		return nil, nil, fmt.Errorf("stdin is not a terminal: %v", err)
+	}
+	ptyMaster, ptyReplica, err := pty.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening pty: %v", err)
+	}
+	p := &Proxy{
+		master:     ptyMaster,
+		detachKeys: detachKeys,
+		detached:   make(chan struct{}),
+		outputDone: make(chan struct{}),
+	}
+	if _, err := p.Resize(); err != nil {
+		ptyMaster.Close()
+		ptyReplica.Close()
+		return nil, nil, err
+	}
+	return p, ptyReplica, nil
+}
+
+// Resize sets the window size of the pty to the window size of the current
+// terminal, and returns it.
+func (p *Proxy) Resize() (*unix.Winsize, error) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdin.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return nil, fmt.Errorf("getting terminal size: %v", err)
+	}
+	if err := unix.IoctlSetWinsize(int(p.master.Fd()), unix.TIOCSWINSZ, ws); err != nil {
+		return nil, fmt.Errorf("setting pty size: %v", err)
+	}
+	return ws, nil
+}
+
+// Start puts the current terminal in raw mode and starts copying data between
+// it and the pty.
+func (p *Proxy) Start() error {
+	fd := int(os.Stdin.Fd())
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return fmt.Errorf("getting terminal attributes: %v", err)
+	}
+	p.termios = termios
+
+	// This is cfmakeraw(3), except that ISIG is kept.
+	raw := *termios
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return fmt.Errorf("setting terminal attributes: %v", err)
+	}
+
+	go func() { // S/R-SAFE: runs outside of the sandbox.
+		defer close(p.outputDone)
+		io.Copy(os.Stdout, p.master)
+	}()
+	go p.copyInput()
+	return nil
+}
+
+// copyInput copies the current terminal's input to the pty until the detach
+// key sequence is read.
+func (p *Proxy) copyInput() {
+	scanner := detachScanner{keys: p.detachKeys}
+	buf := make([]byte, 4096)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			out, detach := scanner.scan(buf[:n])
+			if len(out) > 0 {
+				if _, err := p.master.Write(out); err != nil {
+					return
+				}
+			}
+			if detach {
+				close(p.detached)
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Detached returns a channel that is closed when the user types the detach
+// key sequence.
+func (p *Proxy) Detached() <-chan struct{} {
+	return p.detached
+}
+
+// Close restores the current terminal and closes the pty master. Output that
+// is still buffered in the pty is copied to the terminal first, unless the
+// user detached.
+func (p *Proxy) Close() error {
+	select {
+	case <-p.detached:
+	case <-p.outputDone:
+	case <-time.After(drainTimeout):
+	}
+	if p.termios != nil {
+		if err := unix.IoctlSetTermios(int(os.Stdin.Fd()), unix.TCSETS, p.termios); err != nil {
+			p.master.Close()
+			return fmt.Errorf("restoring terminal attributes: %v", err)
+		}
+	}
+	return p.master.Close()
+}
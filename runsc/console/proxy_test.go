@@ -0,0 +1,119 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package console
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	for _, tc := range []struct {
+		keys string
+		want []byte
+		err  bool
+	}{
+		{keys: "", want: nil},
+		{keys: DefaultDetachKeys, want: []byte{0x10, 0x11}},
+		{keys: "ctrl-A,x,ctrl-@,ctrl-_", want: []byte{0x01, 'x', 0x00, 0x1f}},
+		{keys: "ctrl-", err: true},
+		{keys: "ctrl-1", err: true},
+		{keys: "ctrl-ab", err: true},
+		{keys: "ab", err: true},
+		{keys: "a,,b", err: true},
+	} {
+		t.Run(tc.keys, func(t *testing.T) {
+			got, err := ParseDetachKeys(tc.keys)
+			if tc.err {
+				if err == nil {
+					t.Errorf("ParseDetachKeys(%q) = %v, want error", tc.keys, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDetachKeys(%q) failed: %v", tc.keys, err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("ParseDetachKeys(%q) = %v, want %v", tc.keys, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDetachScanner(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		keys   string
+		in     []string
+		want   string
+		detach bool
+	}{
+		{
+			name: "no keys",
+			in:   []string{"a\x10\x11b"},
+			want: "a\x10\x11b",
+		},
+		{
+			name:   "detach",
+			keys:   "\x10\x11",
+			in:     []string{"ab\x10\x11cd"},
+			want:   "ab",
+			detach: true,
+		},
+		{
+			name:   "detach across reads",
+			keys:   "\x10\x11",
+			in:     []string{"ab\x10", "\x11cd"},
+			want:   "ab",
+			detach: true,
+		},
+		{
+			name: "broken sequence",
+			keys: "\x10\x11",
+			in:   []string{"a\x10", "b\x11"},
+			want: "a\x10b\x11",
+		},
+		{
+			name:   "restarted sequence",
+			keys:   "\x10\x11",
+			in:     []string{"\x10\x10\x11"},
+			want:   "\x10",
+			detach: true,
+		},
+		{
+			name: "withheld prefix",
+			keys: "\x10\x11",
+			in:   []string{"a\x10"},
+			want: "a",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := detachScanner{keys: []byte(tc.keys)}
+			var got []byte
+			detach := false
+			for _, in := range tc.in {
+				out, done := d.scan([]byte(in))
+				got = append(got, out...)
+				if done {
+					detach = true
+					break
+				}
+			}
+			if string(got) != tc.want || detach != tc.detach {
+				t.Errorf("scan(%q) = %q, %t, want %q, %t", tc.in, got, detach, tc.want, tc.detach)
+			}
+		})
+	}
+}
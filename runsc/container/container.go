@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -35,6 +36,8 @@ import (
 	"gvisor.dev/gvisor/pkg/cleanup"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/sentry/state"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sighandling"
 	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/cgroup"
@@ -108,6 +111,10 @@ type Container struct {
 	// Status is the current container Status.
 	Status Status `json:"status"`
 
+	// StatusChangedAt is the time of the last change to Status. It's zero for
+	// containers created by older versions of runsc.
+	StatusChangedAt time.Time `json:"statusChangedAt"`
+
 	// GoferPid is the PID of the gofer running along side the sandbox. May
 	// be 0 if the gofer has been killed.
 	GoferPid int `json:"goferPid"`
@@ -171,6 +178,12 @@ type Args struct {
 	//
 	// It only applies for the init container.
 	Attached bool
+
+	// RestoreImage is the checkpoint image that Run restores the container
+	// from. If RestoreImage is nil, the container is restored from
+	// conf.RestoreFile if it is set, and started normally otherwise.
+	// RestoreImage is read sequentially, so it may be a pipe or a socket.
+	RestoreImage *os.File
 }
 
 // New creates the container in a new Sandbox process, unless the metadata
@@ -195,14 +208,16 @@ func New(conf *config.Config, args Args) (*Container, error) {
 		}
 	}
 
+	now := time.Now()
 	c := &Container{
-		ID:            args.ID,
-		Spec:          args.Spec,
-		ConsoleSocket: args.ConsoleSocket,
-		BundleDir:     args.BundleDir,
-		Status:        Creating,
-		CreatedAt:     time.Now(),
-		Owner:         os.Getenv("USER"),
+		ID:              args.ID,
+		Spec:            args.Spec,
+		ConsoleSocket:   args.ConsoleSocket,
+		BundleDir:       args.BundleDir,
+		Status:          Creating,
+		StatusChangedAt: now,
+		CreatedAt:       now,
+		Owner:           os.Getenv("USER"),
 		Saver: StateFile{
 			RootDir: conf.RootDir,
 			ID: FullID{
@@ -223,6 +238,14 @@ func New(conf *config.Config, args Args) (*Container, error) {
 	}
 	defer c.Saver.unlockOrDie()
 
+	if conf.CoreDumpDir != "" {
+		// Core dumps are written by the sentry relative to the dumping
+		// process' root, so every container gets the core dump directory.
+		if err := addCoreDumpMount(conf, args.Spec); err != nil {
+			return nil, err
+		}
+	}
+
 	// If the metadata annotations indicate that this container should be started
 	// in an existing sandbox, we must do so. These are the possible metadata
 	// annotation states:
@@ -299,6 +322,8 @@ func New(conf *config.Config, args Args) (*Container, error) {
 		}
 		c.Sandbox = sb.Sandbox
 
+		joinSandboxPIDNamespace(args.Spec, c.Sandbox.Getpid())
+
 		subCgroup, err := c.setupCgroupForSubcontainer(conf, args.Spec)
 		if err != nil {
 			return nil, err
@@ -346,8 +371,11 @@ func New(conf *config.Config, args Args) (*Container, error) {
 		if err := executeHooks(c.Spec.Hooks.CreateRuntime, c.State()); err != nil {
 			return nil, err
 		}
-		if len(c.Spec.Hooks.CreateContainer) > 0 {
-			log.Warningf("CreateContainer hook skipped because running inside container namespace is not supported")
+		// "The createContainer hooks MUST be executed in the container
+		// namespace" and "the path MUST resolve in the runtime namespace"
+		// -OCI spec.
+		if err := executeHooksInContext(c.Spec.Hooks.CreateContainer, c.State(), c.hookContext(false)); err != nil {
+			return nil, err
 		}
 	}
 
@@ -363,6 +391,70 @@ func New(conf *config.Config, args Args) (*Container, error) {
 	return c, nil
 }
 
+// joinSandboxPIDNamespace makes a subcontainer join the root container's PID
+// namespace if its spec asks to join the PID namespace of the sandbox process.
+// This is how container runtimes express that the containers of a pod share
+// a process namespace (e.g. Kubernetes' shareProcessNamespace), since the
+// sandbox process stands in for the pod's infrastructure container.
+//
+// The root container always runs in the sandbox's root PID namespace, which
+// subcontainers without a PID namespace in their spec join.
+func joinSandboxPIDNamespace(spec *specs.Spec, sandboxPID int) {
+	if spec.Linux == nil {
+		return
+	}
+	sandboxNS := fmt.Sprintf("/proc/%d/ns/pid", sandboxPID)
+	for i, ns := range spec.Linux.Namespaces {
+		if ns.Type != specs.PIDNamespace || ns.Path == "" {
+			continue
+		}
+		if !sameNamespace(ns.Path, sandboxNS) {
+			return
+		}
+		log.Infof("Container joins the sandbox's PID namespace %q", ns.Path)
+		spec.Linux.Namespaces = append(spec.Linux.Namespaces[:i], spec.Linux.Namespaces[i+1:]...)
+		return
+	}
+}
+
+// sameNamespace returns true if the namespace files at paths a and b refer to
+// the same namespace.
+func sameNamespace(a, b string) bool {
+	if filepath.Clean(a) == b {
+		return true
+	}
+	aFI, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bFI, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aFI, bFI)
+}
+
+// addCoreDumpMount adds a bind mount of the host directory given by
+// --core-dump-dir to spec, at boot.CoreDumpMountPath.
+func addCoreDumpMount(conf *config.Config, spec *specs.Spec) error {
+	dir, err := filepath.Abs(conf.CoreDumpDir)
+	if err != nil {
+		return fmt.Errorf("resolving core dump directory %q: %w", conf.CoreDumpDir, err)
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("core dump directory: %w", err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("core dump directory %q is not a directory", dir)
+	}
+	spec.Mounts = append(spec.Mounts, specs.Mount{
+		Destination: boot.CoreDumpMountPath,
+		Source:      dir,
+		Type:        "bind",
+		Options:     []string{"rw", "nosuid", "nodev", "noexec"},
+	})
+	return nil
+}
+
 // Start starts running the containerized process inside the sandbox.
 func (c *Container) Start(conf *config.Config) error {
 	log.Debugf("Start container, cid: %s", c.ID)
@@ -377,13 +469,10 @@ func (c *Container) Start(conf *config.Config) error {
 		return err
 	}
 
-	// "If any prestart hook fails, the runtime MUST generate an error,
-	// stop and destroy the container" -OCI spec.
-	if c.Spec.Hooks != nil && len(c.Spec.Hooks.StartContainer) > 0 {
-		log.Warningf("StartContainer hook skipped because running inside container namespace is not supported")
-	}
-
 	if isRoot(c.Spec) {
+		if err := c.executeStartContainerHooks(); err != nil {
+			return err
+		}
 		if err := c.Sandbox.StartRoot(c.Spec, conf); err != nil {
 			return err
 		}
@@ -409,6 +498,11 @@ func (c *Container) Start(conf *config.Config) error {
 			}
 			c.Spec.Mounts = cleanMounts
 
+			// The gofer is needed to resolve paths in the container namespace.
+			if err := c.executeStartContainerHooks(); err != nil {
+				return err
+			}
+
 			// Setup stdios if the container is not using terminal. Otherwise TTY was
 			// already setup in create.
 			var stdios []*os.File
@@ -450,6 +544,17 @@ func (c *Container) Start(conf *config.Config) error {
 // Restore takes a container and replaces its kernel and file system
 // to restore a container from its state file.
 func (c *Container) Restore(spec *specs.Spec, conf *config.Config, restoreFile string) error {
+	rf, err := os.Open(restoreFile)
+	if err != nil {
+		return fmt.Errorf("opening restore file %q failed: %v", restoreFile, err)
+	}
+	defer rf.Close()
+	return c.RestoreFrom(spec, conf, rf)
+}
+
+// RestoreFrom is like Restore, but reads the checkpoint image from an open
+// file. The image is read sequentially, so rf doesn't need to be seekable.
+func (c *Container) RestoreFrom(spec *specs.Spec, conf *config.Config, rf *os.File) error {
 	log.Debugf("Restore container, cid: %s", c.ID)
 	if err := c.Saver.lock(); err != nil {
 		return err
@@ -460,19 +565,74 @@ func (c *Container) Restore(spec *specs.Spec, conf *config.Config, restoreFile s
 		return err
 	}
 
-	// "If any prestart hook fails, the runtime MUST generate an error,
-	// stop and destroy the container" -OCI spec.
-	if c.Spec.Hooks != nil && len(c.Spec.Hooks.StartContainer) > 0 {
-		log.Warningf("StartContainer hook skipped because running inside container namespace is not supported")
+	if err := c.executeStartContainerHooks(); err != nil {
+		return err
 	}
 
-	if err := c.Sandbox.Restore(c.ID, spec, conf, restoreFile); err != nil {
+	if err := c.Sandbox.Restore(c.ID, spec, conf, rf); err != nil {
 		return err
 	}
 	c.changeStatus(Running)
 	return c.saveLocked()
 }
 
+// executeStartContainerHooks executes the startContainer hooks, which must run
+// before the container's process is started.
+func (c *Container) executeStartContainerHooks() error {
+	if c.Spec.Hooks == nil || len(c.Spec.Hooks.StartContainer) == 0 {
+		return nil
+	}
+	// "If any startContainer hook fails, the runtime MUST generate an error
+	// and stop the container". "The startContainer hooks MUST be executed in
+	// the container namespace" and "the path MUST resolve in the container
+	// namespace" -OCI spec.
+	if err := executeHooksInContext(c.Spec.Hooks.StartContainer, c.State(), c.hookContext(true)); err != nil {
+		return fmt.Errorf("executing startContainer hooks: %w", err)
+	}
+	return nil
+}
+
+// hookNamespaces maps the types of namespaces that hooks join to their names
+// under /proc/[pid]/ns. The user namespace can't be joined by a multithreaded
+// process, and the PID namespace of the sandbox is owned by the sentry.
+var hookNamespaces = map[specs.LinuxNamespaceType]string{
+	specs.CgroupNamespace:  "cgroup",
+	specs.IPCNamespace:     "ipc",
+	specs.NetworkNamespace: "net",
+	specs.UTSNamespace:     "uts",
+}
+
+// hookContext returns the context used to execute hooks in the container
+// namespace. Containers run inside the sandbox, so hooks join the namespaces
+// of the sandbox process that the container requested in its spec. The
+// container's mount namespace is only visible from the gofer, so if
+// withRoot is true, hooks are also chrooted to the gofer's root, which is the
+// container's root filesystem.
+func (c *Container) hookContext(withRoot bool) hookContext {
+	var hc hookContext
+	if pid := c.SandboxPid(); pid > 0 && c.Spec.Linux != nil {
+		for _, ns := range c.Spec.Linux.Namespaces {
+			name, ok := hookNamespaces[ns.Type]
+			if !ok {
+				continue
+			}
+			hc.namespaces = append(hc.namespaces, specs.LinuxNamespace{
+				Type: ns.Type,
+				Path: fmt.Sprintf("/proc/%d/ns/%s", pid, name),
+			})
+		}
+	}
+	if withRoot {
+		if c.GoferPid != 0 {
+			hc.root = fmt.Sprintf("/proc/%d/root", c.GoferPid)
+		} else if c.Spec.Root != nil {
+			// The spec's root path is made absolute when the spec is read.
+			hc.root = c.Spec.Root.Path
+		}
+	}
+	return hc
+}
+
 // Run is a helper that calls Create + Start + Wait.
 func Run(conf *config.Config, args Args) (unix.WaitStatus, error) {
 	log.Debugf("Run container, cid: %s, rootDir: %q", args.ID, conf.RootDir)
@@ -487,7 +647,12 @@ func Run(conf *config.Config, args Args) (unix.WaitStatus, error) {
 	})
 	defer cu.Clean()
 
-	if conf.RestoreFile != "" {
+	if args.RestoreImage != nil {
+		log.Debugf("Restore: %v", args.RestoreImage.Name())
+		if err := c.RestoreFrom(args.Spec, conf, args.RestoreImage); err != nil {
+			return 0, fmt.Errorf("starting container: %v", err)
+		}
+	} else if conf.RestoreFile != "" {
 		log.Debugf("Restore: %v", conf.RestoreFile)
 		if err := c.Restore(args.Spec, conf, conf.RestoreFile); err != nil {
 			return 0, fmt.Errorf("starting container: %v", err)
@@ -532,6 +697,73 @@ func (c *Container) Event() (*boot.EventOut, error) {
 	return event, nil
 }
 
+// StreamEvents retrieves events for the container every interval and passes
+// them to fn, reusing a single connection to the sandbox. Changes in the
+// container status, e.g. the container being paused or resumed, are reported
+// to fn as an event of type "state" instead of failing the stream. It returns
+// nil once the container stops, or the first error returned by fn.
+func (c *Container) StreamEvents(interval time.Duration, fn func(*boot.Event) error) error {
+	log.Debugf("Streaming events for container, cid: %s, interval: %v", c.ID, interval)
+	if err := c.requireStatus("get events for", Created, Running, Paused); err != nil {
+		return err
+	}
+	stream, err := c.Sandbox.NewEventStream(c.ID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if stream != nil {
+			stream.Close()
+		}
+	}()
+
+	status := c.Status
+	for {
+		// Reload the container to pick up status changes made by other runsc
+		// commands, e.g. "runsc pause".
+		cur, err := Load(c.Saver.RootDir, c.Saver.ID, LoadOpts{Exact: true})
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Container has been deleted.
+				cur = &Container{ID: c.ID, Status: Stopped}
+			} else {
+				return err
+			}
+		}
+		if cur.Status != status {
+			status = cur.Status
+			if err := fn(&boot.Event{Type: "state", ID: c.ID, State: string(status)}); err != nil {
+				return err
+			}
+		}
+		if status == Stopped {
+			return nil
+		}
+
+		if stream == nil {
+			// The previous connection failed, e.g. because the sandbox was busy
+			// saving a checkpoint. Try to reconnect.
+			if stream, err = c.Sandbox.NewEventStream(c.ID); err != nil {
+				log.Warningf("Error reconnecting to sandbox for events: %v", err)
+			}
+		}
+		if stream != nil {
+			ev, err := stream.Next()
+			if err != nil {
+				log.Warningf("Error getting events for container: %v", err)
+				stream.Close()
+				stream = nil
+			} else {
+				c.populateStats(ev)
+				if err := fn(&ev.Event); err != nil {
+					return err
+				}
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
 // SandboxPid returns the Getpid of the sandbox the container is running in, or -1 if the
 // container is not running.
 func (c *Container) SandboxPid() int {
@@ -545,8 +777,15 @@ func (c *Container) SandboxPid() int {
 // Call to wait on a stopped container is needed to retrieve the exit status
 // and wait returns immediately.
 func (c *Container) Wait() (unix.WaitStatus, error) {
-	log.Debugf("Wait on container, cid: %s", c.ID)
-	ws, err := c.Sandbox.Wait(c.ID)
+	return c.WaitTimeout(0)
+}
+
+// WaitTimeout is like Wait, but gives up once timeout has elapsed, in which
+// case an error wrapping boot.ErrWaitTimeout is returned. A timeout of 0 waits
+// indefinitely.
+func (c *Container) WaitTimeout(timeout time.Duration) (unix.WaitStatus, error) {
+	log.Debugf("Wait on container, cid: %s, timeout: %v", c.ID, timeout)
+	ws, err := c.Sandbox.Wait(c.ID, timeout)
 	if err == nil {
 		// Wait succeeded, container is not running anymore.
 		c.changeStatus(Stopped)
@@ -557,21 +796,33 @@ func (c *Container) Wait() (unix.WaitStatus, error) {
 // WaitRootPID waits for process 'pid' in the sandbox's PID namespace and
 // returns its WaitStatus.
 func (c *Container) WaitRootPID(pid int32) (unix.WaitStatus, error) {
+	return c.WaitRootPIDTimeout(pid, 0)
+}
+
+// WaitRootPIDTimeout is like WaitRootPID, but gives up once timeout has
+// elapsed. See WaitTimeout.
+func (c *Container) WaitRootPIDTimeout(pid int32, timeout time.Duration) (unix.WaitStatus, error) {
 	log.Debugf("Wait on process %d in sandbox, cid: %s", pid, c.Sandbox.ID)
 	if !c.IsSandboxRunning() {
 		return 0, fmt.Errorf("sandbox is not running")
 	}
-	return c.Sandbox.WaitPID(c.Sandbox.ID, pid)
+	return c.Sandbox.WaitPID(c.Sandbox.ID, pid, timeout)
 }
 
 // WaitPID waits for process 'pid' in the container's PID namespace and returns
 // its WaitStatus.
 func (c *Container) WaitPID(pid int32) (unix.WaitStatus, error) {
+	return c.WaitPIDTimeout(pid, 0)
+}
+
+// WaitPIDTimeout is like WaitPID, but gives up once timeout has elapsed. See
+// WaitTimeout.
+func (c *Container) WaitPIDTimeout(pid int32, timeout time.Duration) (unix.WaitStatus, error) {
 	log.Debugf("Wait on process %d in container, cid: %s", pid, c.ID)
 	if !c.IsSandboxRunning() {
 		return 0, fmt.Errorf("sandbox is not running")
 	}
-	return c.Sandbox.WaitPID(c.ID, pid)
+	return c.Sandbox.WaitPID(c.ID, pid, timeout)
 }
 
 // SignalContainer sends the signal to the container. If all is true and signal
@@ -584,8 +835,9 @@ func (c *Container) SignalContainer(sig unix.Signal, all bool) error {
 	// an error will be returned anyway; when all=true, this allows
 	// sending signal to other processes inside the container even
 	// after the init process exits. This is especially useful for
-	// container cleanup.
-	if err := c.requireStatus("signal", Running, Stopped); err != nil {
+	// container cleanup. Signals sent to a Paused container are queued
+	// until it is resumed.
+	if err := c.requireStatus("signal", Running, Paused, Stopped); err != nil {
 		return err
 	}
 	if !c.IsSandboxRunning() {
@@ -594,10 +846,25 @@ func (c *Container) SignalContainer(sig unix.Signal, all bool) error {
 	return c.Sandbox.SignalContainer(c.ID, sig, all)
 }
 
+// KillAll sends sig to all processes in the container, waits up to timeout for
+// them to exit, and then sends SIGKILL to any processes that remain. It returns
+// true if SIGKILL had to be sent.
+func (c *Container) KillAll(sig unix.Signal, timeout time.Duration) (bool, error) {
+	log.Debugf("Kill all processes in container, cid: %s, signal: %v (%d), timeout: %v", c.ID, sig, sig, timeout)
+	// As with SignalContainer, processes may remain in a Stopped container.
+	if err := c.requireStatus("kill", Running, Stopped); err != nil {
+		return false, err
+	}
+	if !c.IsSandboxRunning() {
+		return false, fmt.Errorf("sandbox is not running")
+	}
+	return c.Sandbox.KillAll(c.ID, sig, timeout)
+}
+
 // SignalProcess sends sig to a specific process in the container.
 func (c *Container) SignalProcess(sig unix.Signal, pid int32) error {
 	log.Debugf("Signal process %d in container, cid: %s, signal: %v (%d)", pid, c.ID, sig, sig)
-	if err := c.requireStatus("signal a process inside", Running); err != nil {
+	if err := c.requireStatus("signal a process inside", Running, Paused); err != nil {
 		return err
 	}
 	if !c.IsSandboxRunning() {
@@ -606,6 +873,100 @@ func (c *Container) SignalProcess(sig unix.Signal, pid int32) error {
 	return c.Sandbox.SignalProcess(c.ID, int32(pid), sig, false)
 }
 
+// ResizeTTY sets the window size of the TTY attached to a specific process in
+// the container. If pid is 0, the TTY of the container init process is
+// resized.
+func (c *Container) ResizeTTY(pid int32, ws linux.Winsize) error {
+	log.Debugf("Resize TTY of process %d in container, cid: %s, rows: %d, cols: %d", pid, c.ID, ws.Row, ws.Col)
+	if err := c.requireStatus("resize the TTY of a process inside", Running, Paused); err != nil {
+		return err
+	}
+	if !c.IsSandboxRunning() {
+		return fmt.Errorf("sandbox is not running")
+	}
+	return c.Sandbox.ResizeTTY(c.ID, pid, ws)
+}
+
+// Resize changes the number of CPUs and the total memory of the sandbox that
+// the container runs in. A value of 0 leaves the corresponding resource
+// unchanged.
+func (c *Container) Resize(cpus uint, totalMem uint64) error {
+	log.Debugf("Resize sandbox of container, cid: %s, CPUs: %d, total memory: %d", c.ID, cpus, totalMem)
+	if err := c.requireStatus("resize", Running, Paused); err != nil {
+		return err
+	}
+	if !c.IsSandboxRunning() {
+		return fmt.Errorf("sandbox is not running")
+	}
+	return c.Sandbox.Resize(cpus, totalMem)
+}
+
+// SetIOLimits changes the file I/O limits of the container.
+func (c *Container) SetIOLimits(limits usage.IOLimits) error {
+	log.Debugf("Set I/O limits of container, cid: %s, limits: %+v", c.ID, limits)
+	if err := c.requireStatus("set I/O limits of", Running, Paused); err != nil {
+		return err
+	}
+	if !c.IsSandboxRunning() {
+		return fmt.Errorf("sandbox is not running")
+	}
+	return c.Sandbox.SetIOLimits(c.ID, limits)
+}
+
+// RecoverGofer starts a new gofer for the container after its gofer died, and
+// reconnects the container's filesystems in the sandbox to it. The sandbox
+// must have been started with conf.GoferReconnectTimeout set.
+func (c *Container) RecoverGofer(conf *config.Config) error {
+	log.Debugf("Recovering gofer of container, cid: %s", c.ID)
+	if err := c.Saver.lock(); err != nil {
+		return err
+	}
+	defer c.Saver.unlockOrDie()
+
+	if c.Status != Running && c.Status != Paused {
+		return fmt.Errorf("cannot recover gofer of container %q in state %v", c.ID, c.Status)
+	}
+	if !c.IsSandboxRunning() {
+		return fmt.Errorf("sandbox is not running")
+	}
+	if conf.GoferReconnectTimeout == 0 {
+		return fmt.Errorf("gofer recovery requires the gofer-reconnect-timeout flag")
+	}
+	if c.GoferPid != 0 {
+		if err := unix.Kill(c.GoferPid, 0); err == nil {
+			return fmt.Errorf("gofer of container %q is still running, PID: %d", c.ID, c.GoferPid)
+		}
+	}
+
+	// Start the gofer in the same cgroup as the original one.
+	return runInCgroup(c.Sandbox.CgroupJSON.Cgroup, func() error {
+		goferFiles, mountsFile, err := c.createGoferProcess(c.Spec, conf, c.BundleDir, false /* attached */)
+		if err != nil {
+			return fmt.Errorf("creating gofer process: %w", err)
+		}
+		defer func() {
+			_ = mountsFile.Close()
+			for _, f := range goferFiles {
+				_ = f.Close()
+			}
+		}()
+		// The recovered gofer is not waited for by this process.
+		c.goferIsChild = false
+
+		// The sandbox already knows the container's mounts, but the gofer
+		// blocks until they are read.
+		if _, err := specutils.ReadMounts(mountsFile); err != nil {
+			return fmt.Errorf("reading mounts file: %v", err)
+		}
+		if err := c.Sandbox.ReconnectGofer(c.ID, goferFiles); err != nil {
+			log.Warningf("Killing gofer that the sandbox failed to reconnect to, PID: %d", c.GoferPid)
+			_ = unix.Kill(c.GoferPid, unix.SIGKILL)
+			return err
+		}
+		return c.saveLocked()
+	})
+}
+
 // ForwardSignals forwards all signals received by the current process to the
 // container process inside the sandbox. It returns a function that will stop
 // forwarding signals.
@@ -625,15 +986,33 @@ func (c *Container) ForwardSignals(pid int32, fgProcess bool) func() {
 
 // Checkpoint sends the checkpoint call to the container.
 // The statefile will be written to f, the file at the specified image-path.
-func (c *Container) Checkpoint(f *os.File) error {
+// If pagesFile is not nil, the contents of memory are written to it instead,
+// which allows them to be loaded lazily on restore.
+// If key is not nil, the statefile is encrypted and authenticated with it.
+// If resume is true, the sandbox continues running after the checkpoint is
+// taken; otherwise, it exits once the statefile is written.
+func (c *Container) Checkpoint(f, pagesFile *os.File, key []byte, resume bool) error {
 	log.Debugf("Checkpoint container, cid: %s", c.ID)
 	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
 		return err
 	}
-	return c.Sandbox.Checkpoint(c.ID, f)
+	return c.Sandbox.Checkpoint(c.ID, f, pagesFile, key, resume)
+}
+
+// Migrate migrates the container's sandbox to the live migration destination
+// connected to by conn. The sandbox exits once it has been restored at the
+// destination, and keeps running if migration fails.
+func (c *Container) Migrate(conn *os.File, maxRounds int, dirtyThreshold uint64) (state.MigrationStats, error) {
+	log.Debugf("Migrate container, cid: %s", c.ID)
+	if err := c.requireStatus("migrate", Created, Running, Paused); err != nil {
+		return state.MigrationStats{}, err
+	}
+	return c.Sandbox.Migrate(conn, maxRounds, dirtyThreshold)
 }
 
-// Pause suspends the container and its kernel.
+// Pause suspends the container's processes. Other containers in the same
+// sandbox keep running. Signals sent to a paused container are delivered once
+// it is resumed.
 // The call only succeeds if the container's status is created or running.
 func (c *Container) Pause() error {
 	log.Debugf("Pausing container, cid: %s", c.ID)
@@ -653,7 +1032,7 @@ func (c *Container) Pause() error {
 	return c.saveLocked()
 }
 
-// Resume unpauses the container and its kernel.
+// Resume unpauses the container's processes.
 // The call only succeeds if the container's status is paused.
 func (c *Container) Resume() error {
 	log.Debugf("Resuming container, cid: %s", c.ID)
@@ -693,6 +1072,24 @@ func (c *Container) Processes() ([]*control.Process, error) {
 	return c.Sandbox.Processes(c.ID)
 }
 
+// CopyIn extracts the tar stream read from r to path in the container. See
+// control.CopyIn.
+func (c *Container) CopyIn(path string, r *os.File) error {
+	if err := c.requireStatus("copy files into", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.CopyIn(c.ID, path, r)
+}
+
+// CopyOut writes path in the container to w as a tar stream. See
+// control.CopyOut.
+func (c *Container) CopyOut(path string, w *os.File) error {
+	if err := c.requireStatus("copy files out of", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.CopyOut(c.ID, path, w)
+}
+
 // Destroy stops all processes and frees all resources associated with the
 // container.
 func (c *Container) Destroy() error {
@@ -856,6 +1253,25 @@ func (c *Container) waitForStopped() error {
 	return backoff.Retry(op, b)
 }
 
+// openExtImage opens the ext filesystem image at path, which must be a regular
+// file or a block device, for reading by the sandbox.
+func openExtImage(path string) (*os.File, error) {
+	image, err := os.OpenFile(path, os.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening ext4 image: %w", err)
+	}
+	fi, err := image.Stat()
+	if err != nil {
+		image.Close()
+		return nil, fmt.Errorf("stat ext4 image %q: %w", path, err)
+	}
+	if mode := fi.Mode(); !mode.IsRegular() && (mode&os.ModeDevice == 0 || mode&os.ModeCharDevice != 0) {
+		image.Close()
+		return nil, fmt.Errorf("ext4 image %q is not a regular file or block device", path)
+	}
+	return image, nil
+}
+
 func (c *Container) createGoferProcess(spec *specs.Spec, conf *config.Config, bundleDir string, attached bool) ([]*os.File, *os.File, error) {
 	donations := donation.Agency{}
 	defer donations.Close()
@@ -912,24 +1328,55 @@ func (c *Container) createGoferProcess(spec *specs.Spec, conf *config.Config, bu
 	}
 	donations.DonateAndClose("mounts-fd", mountsGofer)
 
-	// Add root mount and then add any other additional mounts.
+	// Add the root mount, and the root overlay's upper layer if any.
 	mountCount := 1
-	for _, m := range spec.Mounts {
-		if specutils.IsGoferMount(m) {
-			mountCount++
+	if overlay2 := conf.GetOverlay2(); overlay2.IsBackedByHostDir() && !spec.Root.Readonly {
+		// The upper layer of the root overlay is stored in a subdirectory
+		// named after the container, so that it is reused when the container
+		// is restarted. It is served on its own connection.
+		upperDir := filepath.Join(overlay2.HostDir(), c.ID)
+		if err := os.MkdirAll(upperDir, 0700); err != nil {
+			return nil, nil, fmt.Errorf("creating overlay upper layer directory %q: %v", upperDir, err)
 		}
+		if err := donations.OpenAndDonate("overlay-upper-fd", upperDir, unix.O_RDONLY|unix.O_DIRECTORY); err != nil {
+			return nil, nil, fmt.Errorf("opening overlay upper layer directory %q: %v", upperDir, err)
+		}
+		mountCount++
 	}
 
-	sandEnds := make([]*os.File, 0, mountCount)
-	for i := 0; i < mountCount; i++ {
+	// The sandbox receives one FD for each of the connections above, followed
+	// by one FD for each submount that needs one, in spec order: a gofer
+	// connection for bind mounts, or the image for ext4 mounts.
+	sandEnds := make([]*os.File, 0, mountCount+len(spec.Mounts))
+	addGoferConn := func() error {
 		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
 		sandEnds = append(sandEnds, os.NewFile(uintptr(fds[0]), "sandbox IO FD"))
 
 		goferEnd := os.NewFile(uintptr(fds[1]), "gofer IO FD")
 		donations.DonateAndClose("io-fds", goferEnd)
+		return nil
+	}
+	for i := 0; i < mountCount; i++ {
+		if err := addGoferConn(); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, m := range spec.Mounts {
+		switch {
+		case specutils.IsGoferMount(m):
+			if err := addGoferConn(); err != nil {
+				return nil, nil, err
+			}
+		case specutils.IsExtImageMount(m):
+			image, err := openExtImage(m.Source)
+			if err != nil {
+				return nil, nil, fmt.Errorf("mount %q: %w", m.Destination, err)
+			}
+			sandEnds = append(sandEnds, image)
+		}
 	}
 
 	if attached {
@@ -1083,6 +1530,9 @@ func (c *Container) changeStatus(s Status) {
 	default:
 		panic(fmt.Sprintf("invalid new state: %v", s))
 	}
+	if c.Status != s {
+		c.StatusChangedAt = time.Now()
+	}
 	c.Status = s
 }
 
@@ -1091,6 +1541,37 @@ func (c *Container) IsSandboxRunning() bool {
 	return c.Sandbox != nil && c.Sandbox.IsRunning()
 }
 
+// IsStale returns true if the container's status says that it exists, but its
+// sandbox process has died without the status being updated, e.g. because the
+// sandbox was killed. Unlike RefreshStatus, IsStale doesn't communicate with
+// the sandbox.
+func (c *Container) IsStale() bool {
+	switch c.Status {
+	case Created, Running, Paused:
+		return !c.IsSandboxRunning()
+	default:
+		return false
+	}
+}
+
+// RefreshStatus checks that a "Created" or "Running" container still exists,
+// setting its status to Stopped if not. The updated status isn't saved.
+//
+// This is inherently racy.
+func (c *Container) RefreshStatus() {
+	switch c.Status {
+	case Created:
+		if !c.IsSandboxRunning() {
+			// Sandbox no longer exists, so this container definitely does not exist.
+			c.changeStatus(Stopped)
+		}
+	case Running:
+		if err := c.SignalContainer(unix.Signal(0), false); err != nil {
+			c.changeStatus(Stopped)
+		}
+	}
+}
+
 func (c *Container) requireStatus(action string, statuses ...Status) error {
 	for _, s := range statuses {
 		if c.Status == s {
@@ -1241,15 +1722,31 @@ func (c *Container) populateStats(event *boot.EventOut) {
 		return
 	}
 
-	// Get the host cgroup CPU usage.
-	cgroupsUsage, err := cgroup.CPUUsage()
+	// Get the host cgroup stats.
+	stats, err := cgroup.Stats()
 	if err != nil {
 		// No cgroup usage, so rely purely on the sentry's accounting.
-		log.Warningf("events: failed when getting cgroup CPU usage for container: %v", err)
+		log.Warningf("events: failed when getting cgroup stats for container: %v", err)
 		event.Event.Data.CPU.Usage.Total = containerUsage
 		return
 	}
 
+	// Memory and pids limits apply to the whole sandbox, so report them for
+	// all containers. Memory usage is still the sentry's accounting.
+	mem := &event.Event.Data.Memory
+	mem.Usage.Limit = stats.MemoryLimit
+	mem.Usage.Max = stats.MemoryMaxUsage
+	mem.Usage.Failcnt = stats.MemoryFailcnt
+	mem.Cache = stats.MemoryCache
+	mem.Swap = boot.MemoryEntry{
+		Usage: stats.SwapUsage,
+		Limit: stats.SwapLimit,
+	}
+	mem.Raw = stats.MemoryStat
+	event.Event.Data.Pids.Limit = stats.PidsLimit
+
+	cgroupsUsage := stats.CPUUsage
+
 	// If the sentry reports no CPU usage, fall back on cgroups and split usage
 	// equally across containers.
 	if allContainersUsage == 0 {
@@ -1263,6 +1760,11 @@ func (c *Container) populateStats(event *boot.EventOut) {
 	total := float64(containerUsage) * (float64(cgroupsUsage) / float64(allContainersUsage))
 	log.Debugf("Usage, container: %d, cgroups: %d, all: %d, total: %.0f", containerUsage, cgroupsUsage, allContainersUsage, total)
 	event.Event.Data.CPU.Usage.Total = uint64(total)
+	// User and kernel time are split in the same proportion as the total.
+	if cgroupsUsage != 0 {
+		event.Event.Data.CPU.Usage.User = uint64(total * (float64(stats.CPUUser) / float64(cgroupsUsage)))
+		event.Event.Data.CPU.Usage.Kernel = uint64(total * (float64(stats.CPUKernel) / float64(cgroupsUsage)))
+	}
 	return
 }
 
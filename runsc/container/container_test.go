@@ -15,7 +15,9 @@
 package container
 
 import (
+	"archive/tar"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -24,6 +26,7 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
@@ -42,6 +45,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/test/testutil"
 	"gvisor.dev/gvisor/pkg/urpc"
+	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/cgroup"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/flag"
@@ -925,6 +929,74 @@ func TestExecProcList(t *testing.T) {
 	}
 }
 
+// TestExecLimits verifies that limits given to exec are reported to the
+// exec'd process and don't affect the container.
+func TestExecLimits(t *testing.T) {
+	for name, conf := range configs(t, false /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			spec, _ := sleepSpecConf(t)
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			// Create and start the container.
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+
+			const memoryLimit = 64 << 20
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatalf("os.Pipe(): %v", err)
+			}
+			defer r.Close()
+			execArgs := &control.ExecArgs{
+				Filename:    "/bin/cat",
+				Argv:        []string{"/bin/cat", "/proc/self/limits"},
+				CPUs:        0.5,
+				MemoryLimit: memoryLimit,
+				FilePayload: urpc.FilePayload{Files: []*os.File{os.Stdin, w, w}},
+			}
+			ws, err := cont.executeSync(conf, execArgs)
+			w.Close()
+			if err != nil {
+				t.Fatalf("executeSync(%+v): %v", execArgs, err)
+			}
+			if ws != 0 {
+				t.Fatalf("exec failed, status: %v", ws)
+			}
+			out, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("reading exec output: %v", err)
+			}
+			if re := regexp.MustCompile(fmt.Sprintf(`Max resident set\s+%d\s+%d\s`, memoryLimit, memoryLimit)); !re.Match(out) {
+				t.Errorf("/proc/self/limits doesn't report the memory limit, got:\n%s", out)
+			}
+
+			// Processes started without limits are unaffected.
+			out, err = executeCombinedOutput(conf, cont, "/bin/cat", "/proc/self/limits")
+			if err != nil {
+				t.Fatalf("exec failed: %v", err)
+			}
+			if strings.Contains(string(out), strconv.Itoa(memoryLimit)) {
+				t.Errorf("/proc/self/limits reports the memory limit of another exec, got:\n%s", out)
+			}
+		})
+	}
+}
+
 // TestKillPid verifies that we can signal individual exec'd processes.
 func TestKillPid(t *testing.T) {
 	for name, conf := range configs(t, false /* noOverlay */) {
@@ -997,6 +1069,192 @@ func TestKillPid(t *testing.T) {
 	}
 }
 
+// TestKillAllTimeout checks that KillAll only resorts to SIGKILL if the
+// processes in the container don't exit after the first signal.
+func TestKillAllTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		cmd        string
+		procs      int
+		sig        unix.Signal
+		wantForced bool
+	}{
+		{
+			name:       "graceful",
+			cmd:        "sleep 1000 & sleep 1000",
+			procs:      3,
+			sig:        unix.SIGKILL,
+			wantForced: false,
+		},
+		{
+			name:       "forced",
+			cmd:        "trap '' TERM; sleep 1000 & sleep 1000",
+			procs:      3,
+			sig:        unix.SIGTERM,
+			wantForced: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := testutil.NewSpecWithArgs("/bin/sh", "-c", tc.cmd)
+			conf := testutil.TestConfig(t)
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+			if err := waitForProcessCount(cont, tc.procs); err != nil {
+				t.Fatalf("timed out waiting for processes to start: %v", err)
+			}
+
+			forced, err := cont.KillAll(tc.sig, time.Second)
+			if err != nil {
+				t.Fatalf("KillAll failed: %v", err)
+			}
+			if forced != tc.wantForced {
+				t.Errorf("KillAll got forced = %t, want %t", forced, tc.wantForced)
+			}
+			if _, err := cont.WaitTimeout(10 * time.Second); err != nil {
+				t.Errorf("error waiting for container: %v", err)
+			}
+		})
+	}
+}
+
+// TestHooks checks that OCI hooks are executed with the container state and
+// that a failing startContainer hook aborts the start of the container.
+func TestHooks(t *testing.T) {
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "hooks-test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("error chmoding file: %q, %v", dir, err)
+	}
+
+	writeState := func(name string) specs.Hook {
+		return specs.Hook{
+			Path: "/bin/sh",
+			Args: []string{"/bin/sh", "-c", fmt.Sprintf("cat > %s", filepath.Join(dir, name))},
+		}
+	}
+
+	spec, conf := sleepSpecConf(t)
+	spec.Hooks = &specs.Hooks{
+		CreateRuntime:   []specs.Hook{writeState("createRuntime")},
+		CreateContainer: []specs.Hook{writeState("createContainer")},
+		StartContainer:  []specs.Hook{{Path: "/bin/false", Args: []string{"/bin/false"}}},
+	}
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+
+	for _, name := range []string{"createRuntime", "createContainer"} {
+		state, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s hook wasn't executed: %v", name, err)
+		}
+		if !strings.Contains(string(state), args.ID) {
+			t.Errorf("%s hook got state %q, want container ID %q", name, state, args.ID)
+		}
+	}
+
+	if err := cont.Start(conf); err == nil {
+		t.Fatalf("container started despite failing startContainer hook")
+	}
+	if got, want := cont.Status, Created; got != want {
+		t.Errorf("container status got %v, want %v", got, want)
+	}
+}
+
+// TestMemoryBreakdown checks that the memory breakdown agrees with the memory
+// usage reported by events.
+func TestMemoryBreakdown(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	expectedPL := []*control.Process{
+		newProcessBuilder().Cmd("sleep").Process(),
+	}
+	if err := waitForProcessList(cont, expectedPL); err != nil {
+		t.Fatalf("failed to wait for sleep to start: %v", err)
+	}
+
+	evt, err := cont.Event()
+	if err != nil {
+		t.Fatalf("Container.Event(): %v", err)
+	}
+	breakdown, err := cont.Sandbox.MemoryBreakdown()
+	if err != nil {
+		t.Fatalf("MemoryBreakdown(): %v", err)
+	}
+
+	// Memory usage may change between the two calls, e.g. due to background
+	// allocations by the sentry.
+	const tolerance = 16 << 20
+	got, want := breakdown.Usage.Total, evt.Event.Data.Memory.Usage.Usage
+	if diff := int64(got) - int64(want); diff > tolerance || diff < -tolerance {
+		t.Errorf("MemoryBreakdown total usage = %d, events usage = %d, want difference within %d", got, want, tolerance)
+	}
+	if rss := breakdown.ContainerRSS[cont.ID]; rss == 0 {
+		t.Errorf("MemoryBreakdown container RSS = 0, want > 0: %+v", breakdown.ContainerRSS)
+	}
+	mfStats := breakdown.MemoryFile
+	if mfStats.Pinned+mfStats.Reclaimable != mfStats.Allocated {
+		t.Errorf("MemoryFile pinned (%d) + reclaimable (%d) != allocated (%d)", mfStats.Pinned, mfStats.Reclaimable, mfStats.Allocated)
+	}
+	if mfStats.Allocated > mfStats.FileSize {
+		t.Errorf("MemoryFile allocated (%d) > file size (%d)", mfStats.Allocated, mfStats.FileSize)
+	}
+	if breakdown.GoRuntime.HeapAlloc == 0 {
+		t.Errorf("Go runtime HeapAlloc = 0, want > 0")
+	}
+}
+
 // TestCheckpointRestore creates a container that continuously writes successive
 // integers to a file. To test checkpoint and restore functionality, the
 // container is checkpointed and the last number printed to the file is
@@ -1062,7 +1320,7 @@ func TestCheckpointRestore(t *testing.T) {
 			}
 
 			// Checkpoint running container; save state into new file.
-			if err := cont.Checkpoint(file); err != nil {
+			if err := cont.Checkpoint(file, nil /* pagesFile */, nil /* key */, false /* resume */); err != nil {
 				t.Fatalf("error checkpointing container to empty file: %v", err)
 			}
 			defer os.RemoveAll(imagePath)
@@ -1162,6 +1420,372 @@ func TestCheckpointRestore(t *testing.T) {
 	}
 }
 
+// checkpointWithPages checkpoints cont into a state file and a pages file
+// created in dir, and returns their paths.
+func checkpointWithPages(cont *Container, dir string) (string, string, error) {
+	imagePath := filepath.Join(dir, "test-image-file")
+	file, err := os.OpenFile(imagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		return "", "", fmt.Errorf("error opening new file at imagePath: %v", err)
+	}
+	defer file.Close()
+	pagesPath := filepath.Join(dir, "test-pages-file")
+	pagesFile, err := os.OpenFile(pagesPath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		return "", "", fmt.Errorf("error opening new file at pagesPath: %v", err)
+	}
+	defer pagesFile.Close()
+	if err := cont.Checkpoint(file, pagesFile, nil /* key */, false /* resume */); err != nil {
+		return "", "", fmt.Errorf("error checkpointing container: %v", err)
+	}
+	return imagePath, pagesPath, nil
+}
+
+// TestCheckpointRestoreLazyPages checks that a container checkpointed with a
+// separate pages file can be restored with its memory loaded on demand, and
+// that a checkpoint of the restored container is complete.
+func TestCheckpointRestoreLazyPages(t *testing.T) {
+	// Skip overlay because test requires writing to host file.
+	for name, conf := range configs(t, true /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "checkpoint-test")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if err := os.Chmod(dir, 0777); err != nil {
+				t.Fatalf("error chmoding file: %q, %v", dir, err)
+			}
+
+			outputPath := filepath.Join(dir, "output")
+			outputFile, err := createWriteableOutputFile(outputPath)
+			if err != nil {
+				t.Fatalf("error creating output file: %v", err)
+			}
+			defer outputFile.Close()
+
+			script := fmt.Sprintf("for ((i=0; ;i++)); do echo $i >> %q; sleep 1; done", outputPath)
+			spec := testutil.NewSpecWithArgs("bash", "-c", script)
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+			if err := waitForFileNotEmpty(outputFile); err != nil {
+				t.Fatalf("Failed to wait for output file: %v", err)
+			}
+
+			for i, lazy := range []bool{true, false} {
+				imageDir := filepath.Join(dir, fmt.Sprintf("image-%d", i))
+				if err := os.Mkdir(imageDir, 0755); err != nil {
+					t.Fatalf("error creating image directory: %v", err)
+				}
+				imagePath, pagesPath, err := checkpointWithPages(cont, imageDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lastNum, err := readOutputNum(outputPath, -1)
+				if err != nil {
+					t.Fatalf("error with outputFile: %v", err)
+				}
+				cont.Destroy()
+
+				// Delete and recreate file before restoring.
+				if err := os.Remove(outputPath); err != nil {
+					t.Fatalf("error removing file")
+				}
+				outputFile, err := createWriteableOutputFile(outputPath)
+				if err != nil {
+					t.Fatalf("error creating output file: %v", err)
+				}
+				defer outputFile.Close()
+
+				restoreConf := *conf
+				restoreConf.RestorePagesFile = pagesPath
+				restoreConf.RestoreLazyPages = lazy
+				args := Args{
+					ID:        testutil.RandomContainerID(),
+					Spec:      spec,
+					BundleDir: bundleDir,
+				}
+				cont, err = New(&restoreConf, args)
+				if err != nil {
+					t.Fatalf("error creating container: %v", err)
+				}
+				defer cont.Destroy()
+				if err := cont.Restore(spec, &restoreConf, imagePath); err != nil {
+					t.Fatalf("error restoring container (lazy: %t): %v", lazy, err)
+				}
+				if err := waitForFileNotEmpty(outputFile); err != nil {
+					t.Fatalf("Failed to wait for output file: %v", err)
+				}
+				firstNum, err := readOutputNum(outputPath, 0)
+				if err != nil {
+					t.Fatalf("error with outputFile: %v", err)
+				}
+				if lastNum+1 != firstNum {
+					t.Errorf("error numbers not in order (lazy: %t), previous: %d, next: %d", lazy, lastNum, firstNum)
+				}
+			}
+		})
+	}
+}
+
+// TestCheckpointRestoreStream checks that a container can be checkpointed to
+// and restored from pipes, which can't be seeked.
+func TestCheckpointRestoreStream(t *testing.T) {
+	// Skip overlay because test requires writing to host file.
+	for name, conf := range configs(t, true /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "checkpoint-test")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if err := os.Chmod(dir, 0777); err != nil {
+				t.Fatalf("error chmoding file: %q, %v", dir, err)
+			}
+
+			outputPath := filepath.Join(dir, "output")
+			outputFile, err := createWriteableOutputFile(outputPath)
+			if err != nil {
+				t.Fatalf("error creating output file: %v", err)
+			}
+			defer outputFile.Close()
+
+			script := fmt.Sprintf("for ((i=0; ;i++)); do echo $i >> %q; sleep 1; done", outputPath)
+			spec := testutil.NewSpecWithArgs("bash", "-c", script)
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+			if err := waitForFileNotEmpty(outputFile); err != nil {
+				t.Fatalf("Failed to wait for output file: %v", err)
+			}
+
+			// Checkpoint into a pipe, reading the image concurrently.
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatalf("os.Pipe failed: %v", err)
+			}
+			imageCh := make(chan []byte, 1)
+			go func() {
+				image, _ := ioutil.ReadAll(r)
+				r.Close()
+				imageCh <- image
+			}()
+			err = cont.Checkpoint(w, nil /* pagesFile */, nil /* key */, false /* resume */)
+			w.Close()
+			image := <-imageCh
+			if err != nil {
+				t.Fatalf("error checkpointing container: %v", err)
+			}
+			if len(image) == 0 {
+				t.Fatalf("checkpoint image is empty")
+			}
+			lastNum, err := readOutputNum(outputPath, -1)
+			if err != nil {
+				t.Fatalf("error with outputFile: %v", err)
+			}
+			cont.Destroy()
+
+			// Delete and recreate file before restoring.
+			if err := os.Remove(outputPath); err != nil {
+				t.Fatalf("error removing file")
+			}
+			outputFile2, err := createWriteableOutputFile(outputPath)
+			if err != nil {
+				t.Fatalf("error creating output file: %v", err)
+			}
+			defer outputFile2.Close()
+
+			// Restore from another pipe, writing the image concurrently.
+			r, w, err = os.Pipe()
+			if err != nil {
+				t.Fatalf("os.Pipe failed: %v", err)
+			}
+			defer r.Close()
+			go func() {
+				w.Write(image)
+				w.Close()
+			}()
+			args2 := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont2, err := New(conf, args2)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont2.Destroy()
+			if err := cont2.RestoreFrom(spec, conf, r); err != nil {
+				t.Fatalf("error restoring container: %v", err)
+			}
+			if err := waitForFileNotEmpty(outputFile2); err != nil {
+				t.Fatalf("Failed to wait for output file: %v", err)
+			}
+			firstNum, err := readOutputNum(outputPath, 0)
+			if err != nil {
+				t.Fatalf("error with outputFile: %v", err)
+			}
+			if lastNum+1 != firstNum {
+				t.Errorf("error numbers not in order, previous: %d, next: %d", lastNum, firstNum)
+			}
+		})
+	}
+}
+
+// TestCheckpointLeaveRunning checks that a container keeps running after
+// being checkpointed with resume set, and that each of the images taken from
+// the running container can be restored.
+func TestCheckpointLeaveRunning(t *testing.T) {
+	// Skip overlay because test requires writing to host file.
+	for name, conf := range configs(t, true /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "checkpoint-test")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if err := os.Chmod(dir, 0777); err != nil {
+				t.Fatalf("error chmoding file: %q, %v", dir, err)
+			}
+
+			outputPath := filepath.Join(dir, "output")
+			outputFile, err := createWriteableOutputFile(outputPath)
+			if err != nil {
+				t.Fatalf("error creating output file: %v", err)
+			}
+			defer outputFile.Close()
+
+			script := fmt.Sprintf("for ((i=0; ;i++)); do echo $i >> %q; sleep 1; done", outputPath)
+			spec := testutil.NewSpecWithArgs("bash", "-c", script)
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			// Create and start the container.
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+
+			// Wait until application has ran.
+			if err := waitForFileNotEmpty(outputFile); err != nil {
+				t.Fatalf("Failed to wait for output file: %v", err)
+			}
+
+			// Checkpoint the running container twice.
+			var images []string
+			for i := 0; i < 2; i++ {
+				imagePath := filepath.Join(dir, fmt.Sprintf("test-image-file-%d", i))
+				file, err := os.OpenFile(imagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+				if err != nil {
+					t.Fatalf("error opening new file at imagePath: %v", err)
+				}
+				defer file.Close()
+				if err := cont.Checkpoint(file, nil /* pagesFile */, nil /* key */, true /* resume */); err != nil {
+					t.Fatalf("error checkpointing container: %v", err)
+				}
+				images = append(images, imagePath)
+
+				// The application must still make progress.
+				lastNum, err := readOutputNum(outputPath, -1)
+				if err != nil {
+					t.Fatalf("error with outputFile: %v", err)
+				}
+				cb := func() error {
+					num, err := readOutputNum(outputPath, -1)
+					if err != nil {
+						return err
+					}
+					if num <= lastNum {
+						return fmt.Errorf("application didn't make progress after checkpoint, last: %d, current: %d", lastNum, num)
+					}
+					return nil
+				}
+				if err := testutil.Poll(cb, 10*time.Second); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := cont.Destroy(); err != nil {
+				t.Fatalf("error destroying container: %v", err)
+			}
+
+			// Restore each image into a new container.
+			for _, imagePath := range images {
+				if err := os.Remove(outputPath); err != nil {
+					t.Fatalf("error removing file")
+				}
+				outputFile, err := createWriteableOutputFile(outputPath)
+				if err != nil {
+					t.Fatalf("error creating output file: %v", err)
+				}
+				defer outputFile.Close()
+
+				args := Args{
+					ID:        testutil.RandomContainerID(),
+					Spec:      spec,
+					BundleDir: bundleDir,
+				}
+				restored, err := New(conf, args)
+				if err != nil {
+					t.Fatalf("error creating container: %v", err)
+				}
+				defer restored.Destroy()
+				if err := restored.Restore(spec, conf, imagePath); err != nil {
+					t.Fatalf("error restoring container from %q: %v", imagePath, err)
+				}
+				if err := waitForFileNotEmpty(outputFile); err != nil {
+					t.Fatalf("Failed to wait for output file: %v", err)
+				}
+				restored.Destroy()
+			}
+		})
+	}
+}
+
 // TestUnixDomainSockets checks that Checkpoint/Restore works in cases
 // with filesystem Unix Domain Socket use.
 func TestUnixDomainSockets(t *testing.T) {
@@ -1241,7 +1865,7 @@ func TestUnixDomainSockets(t *testing.T) {
 			}
 
 			// Checkpoint running container; save state into new file.
-			if err := cont.Checkpoint(file); err != nil {
+			if err := cont.Checkpoint(file, nil /* pagesFile */, nil /* key */, false /* resume */); err != nil {
 				t.Fatalf("error checkpointing container to empty file: %v", err)
 			}
 
@@ -1435,6 +2059,83 @@ func TestPauseResumeStatus(t *testing.T) {
 	}
 }
 
+// TestStreamEvents checks that events can be streamed over a single sandbox
+// connection, that status changes are reported, and that the stream ends once
+// the container stops.
+func TestStreamEvents(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	events := make(chan boot.Event, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- cont.StreamEvents(10*time.Millisecond, func(ev *boot.Event) error {
+			events <- *ev
+			return nil
+		})
+	}()
+	waitFor := func(typ, state string) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case ev := <-events:
+				if ev.ID != cont.ID {
+					t.Errorf("wrong container ID, want: %s, got: %s", cont.ID, ev.ID)
+				}
+				if ev.Type == typ && ev.State == state {
+					return
+				}
+			case err := <-done:
+				t.Fatalf("stream ended while waiting for event %q/%q: %v", typ, state, err)
+			case <-timeout:
+				t.Fatalf("timeout waiting for event %q/%q", typ, state)
+			}
+		}
+	}
+
+	waitFor("stats", "")
+	if err := cont.Pause(); err != nil {
+		t.Fatalf("error pausing container: %v", err)
+	}
+	waitFor("state", string(Paused))
+	if err := cont.Resume(); err != nil {
+		t.Fatalf("error resuming container: %v", err)
+	}
+	waitFor("state", string(Running))
+
+	if err := cont.Destroy(); err != nil {
+		t.Fatalf("error destroying container: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("StreamEvents() failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("timeout waiting for StreamEvents() to return")
+	}
+}
+
 // TestCapabilities verifies that:
 //   - Running exec as non-root UID and GID will result in an error (because the
 //     executable file can't be read).
@@ -1642,6 +2343,125 @@ func TestReadonlyRoot(t *testing.T) {
 	}
 }
 
+// TestCopy checks that files copied into a container with CopyIn are copied
+// back out with CopyOut, and that nothing is read when copying into a
+// read-only mount.
+func TestCopy(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	spec.Root.Readonly = true
+	spec.Mounts = append(spec.Mounts, specs.Mount{
+		Type:        "tmpfs",
+		Destination: "/tmp",
+	})
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	mtime := time.Unix(1234567890, 0)
+	want := []tar.Header{
+		{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0750},
+		{Typeflag: tar.TypeReg, Name: "dir/file", Mode: 0640, Size: 6},
+		{Typeflag: tar.TypeSymlink, Name: "dir/link", Mode: 0777, Linkname: "file"},
+	}
+	in, err := ioutil.TempFile(testutil.TmpDir(), "copy-in")
+	if err != nil {
+		t.Fatalf("error creating input file: %v", err)
+	}
+	defer in.Close()
+	tw := tar.NewWriter(in)
+	for _, hdr := range want {
+		hdr := hdr
+		hdr.ModTime = mtime
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("WriteHeader(%q): %v", hdr.Name, err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte("hello\n")); err != nil {
+				t.Fatalf("Write(%q): %v", hdr.Name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close: %v", err)
+	}
+
+	// Copying into the read-only root must fail without consuming the
+	// stream.
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	if err := cont.CopyIn("/etc", in); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("CopyIn(/etc) = %v, want read-only file system error", err)
+	}
+	if off, err := in.Seek(0, io.SeekCurrent); err != nil || off != 0 {
+		t.Errorf("input offset after failed CopyIn = %d, %v, want 0", off, err)
+	}
+
+	if err := cont.CopyIn("/tmp", in); err != nil {
+		t.Fatalf("CopyIn(/tmp) failed: %v", err)
+	}
+	out, err := ioutil.TempFile(testutil.TmpDir(), "copy-out")
+	if err != nil {
+		t.Fatalf("error creating output file: %v", err)
+	}
+	defer out.Close()
+	if err := cont.CopyOut("/tmp/dir", out); err != nil {
+		t.Fatalf("CopyOut(/tmp/dir) failed: %v", err)
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+
+	tr := tar.NewReader(out)
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if i != len(want) {
+				t.Errorf("got %d entries, want %d", i, len(want))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar stream: %v", err)
+		}
+		if i >= len(want) {
+			t.Fatalf("unexpected entry %q", hdr.Name)
+		}
+		w := want[i]
+		if hdr.Typeflag != w.Typeflag || hdr.Name != w.Name || hdr.Mode != w.Mode || hdr.Size != w.Size || hdr.Linkname != w.Linkname {
+			t.Errorf("got entry %+v, want %+v", hdr, w)
+		}
+		if w.Typeflag != tar.TypeSymlink && !hdr.ModTime.Equal(mtime) {
+			t.Errorf("%q: got mtime %v, want %v", hdr.Name, hdr.ModTime, mtime)
+		}
+		if w.Typeflag == tar.TypeReg {
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("reading %q: %v", hdr.Name, err)
+			}
+			if string(data) != "hello\n" {
+				t.Errorf("%q: got contents %q, want %q", hdr.Name, data, "hello\n")
+			}
+		}
+	}
+}
+
 func TestReadonlyMount(t *testing.T) {
 	for name, conf := range configs(t, false /* noOverlay */) {
 		t.Run(name, func(t *testing.T) {
@@ -2024,6 +2844,115 @@ func TestWaitOnExitedSandbox(t *testing.T) {
 	}
 }
 
+// TestWaitTimeout checks that waits give up once their timeout expires, and
+// that the container can still be waited on afterwards.
+func TestWaitTimeout(t *testing.T) {
+	const wantExit = 17
+	cmd := fmt.Sprintf("sleep 3; exit %d", wantExit)
+	spec := testutil.NewSpecWithArgs("/bin/sh", "-c", cmd)
+	conf := testutil.TestConfig(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and Start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	c, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer c.Destroy()
+	if err := c.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	if _, err := c.WaitTimeout(100 * time.Millisecond); !errors.Is(err, boot.ErrWaitTimeout) {
+		t.Fatalf("WaitTimeout() got error: %v, want: %v", err, boot.ErrWaitTimeout)
+	}
+	if _, err := c.WaitPIDTimeout(1, 100*time.Millisecond); !errors.Is(err, boot.ErrWaitTimeout) {
+		t.Fatalf("WaitPIDTimeout() got error: %v, want: %v", err, boot.ErrWaitTimeout)
+	}
+
+	ws, err := c.WaitTimeout(time.Minute)
+	if err != nil {
+		t.Fatalf("error waiting on container: %v", err)
+	}
+	if got := ws.ExitStatus(); got != wantExit {
+		t.Errorf("got exit status %d, want %d", got, wantExit)
+	}
+}
+
+// TestStaleSandbox checks that a container whose sandbox was killed is
+// reported as stale, and that RefreshStatus then marks it as stopped.
+func TestStaleSandbox(t *testing.T) {
+	spec := testutil.NewSpecWithArgs("/bin/sleep", "100")
+	conf := testutil.TestConfig(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and Start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	c, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer c.Destroy()
+	created := c.StatusChangedAt
+	if err := c.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	if !c.StatusChangedAt.After(created) {
+		t.Errorf("StatusChangedAt not updated by Start: got %v, created at %v", c.StatusChangedAt, created)
+	}
+	if c.IsStale() {
+		t.Fatalf("running container is stale")
+	}
+
+	// Kill the sandbox behind runsc's back.
+	if err := unix.Kill(c.Sandbox.Getpid(), unix.SIGKILL); err != nil {
+		t.Fatalf("error killing sandbox: %v", err)
+	}
+	if err := testutil.Poll(func() error {
+		if c.IsSandboxRunning() {
+			return fmt.Errorf("sandbox is still running")
+		}
+		return nil
+	}, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(conf.RootDir, c.Saver.ID, LoadOpts{Exact: true, SkipCheck: true})
+	if err != nil {
+		t.Fatalf("error loading container: %v", err)
+	}
+	if got := loaded.Status; got != Running {
+		t.Errorf("loaded container status got %v, want %v", got, Running)
+	}
+	if !loaded.IsStale() {
+		t.Errorf("container with a dead sandbox is not stale")
+	}
+	loaded.RefreshStatus()
+	if got := loaded.Status; got != Stopped {
+		t.Errorf("refreshed container status got %v, want %v", got, Stopped)
+	}
+	if loaded.IsStale() {
+		t.Errorf("stopped container is stale")
+	}
+}
+
 func TestDestroyNotStarted(t *testing.T) {
 	spec := testutil.NewSpecWithArgs("/bin/sleep", "100")
 	conf := testutil.TestConfig(t)
@@ -2634,6 +3563,119 @@ func TestReduce(t *testing.T) {
 	}
 }
 
+// TestPageout checks that madvise(MADV_PAGEOUT) on a large allocation that is
+// no longer used releases the memory backing it on the host.
+func TestPageout(t *testing.T) {
+	app, err := testutil.FindFile("test/cmd/test_app/test_app")
+	if err != nil {
+		t.Fatal("error finding test_app:", err)
+	}
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "pageout")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const size = 256 << 20
+	spec, conf := sleepSpecConf(t)
+	spec.Process.Args = []string{app, "pageout", "--dir", dir, "--size", strconv.Itoa(size)}
+	spec.Mounts = append(spec.Mounts, specs.Mount{
+		Type:        "bind",
+		Destination: dir,
+		Source:      dir,
+	})
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("Creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("starting container: %v", err)
+	}
+
+	if err := waitForFileExist(filepath.Join(dir, "allocated")); err != nil {
+		t.Fatalf("error waiting for allocation: %v", err)
+	}
+	before, err := processTreeRSS(cont.Sandbox.Getpid())
+	if err != nil {
+		t.Fatalf("error reading sandbox RSS: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pageout"), nil, 0644); err != nil {
+		t.Fatalf("error requesting pageout: %v", err)
+	}
+	if err := waitForFileExist(filepath.Join(dir, "done")); err != nil {
+		t.Fatalf("error waiting for pageout: %v", err)
+	}
+	after, err := processTreeRSS(cont.Sandbox.Getpid())
+	if err != nil {
+		t.Fatalf("error reading sandbox RSS: %v", err)
+	}
+	t.Logf("Sandbox RSS before pageout: %d, after: %d", before, after)
+	if after > before || before-after < size/2 {
+		t.Errorf("sandbox RSS dropped from %d to %d, want a drop of at least %d", before, after, size/2)
+	}
+}
+
+// processTreeRSS returns the sum of the resident set sizes, in bytes, of the
+// process with the given PID and all of its descendants.
+func processTreeRSS(pid int) (uint64, error) {
+	status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	var rss uint64
+	for _, line := range strings.Split(string(status), "\n") {
+		if !strings.HasPrefix(line, "VmRSS:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return 0, fmt.Errorf("malformed VmRSS line: %q", line)
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("malformed VmRSS line %q: %v", line, err)
+		}
+		rss = kb << 10
+	}
+
+	tasks, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return 0, err
+	}
+	for _, task := range tasks {
+		children, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%s/children", pid, task.Name()))
+		if err != nil {
+			// The task may have exited.
+			continue
+		}
+		for _, child := range strings.Fields(string(children)) {
+			childPID, err := strconv.Atoi(child)
+			if err != nil {
+				return 0, fmt.Errorf("malformed children file: %q", children)
+			}
+			childRSS, err := processTreeRSS(childPID)
+			if err != nil {
+				// The child may have exited.
+				continue
+			}
+			rss += childRSS
+		}
+	}
+	return rss, nil
+}
+
 // TestProfile checks that profiling options generate profiles.
 func TestProfile(t *testing.T) {
 	// Perform a non-trivial amount of work so we actually capture
@@ -2713,3 +3755,74 @@ func TestSaveSystemdCgroup(t *testing.T) {
 		t.Errorf("CompatCgroup not properly saved: want %v, got %v", cont.CompatCgroup, loadCont.CompatCgroup)
 	}
 }
+
+// TestOverlayHostDir checks that modifications to the root filesystem are
+// stored in the overlay's host directory, and are visible to the container
+// after it is restarted.
+func TestOverlayHostDir(t *testing.T) {
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "overlay-host-dir")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Files in dir are part of the lower layer, since the test's root
+	// filesystem is the host's.
+	lowerFile := path.Join(dir, "lower")
+	if err := ioutil.WriteFile(lowerFile, []byte("lower"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(): %v", err)
+	}
+	upperFile := path.Join(dir, "upper")
+	upperDir := path.Join(dir, "upper-layer")
+
+	conf := testutil.TestConfig(t)
+	if err := conf.Overlay2.Set("root:dir=" + upperDir); err != nil {
+		t.Fatalf("Overlay2.Set(): %v", err)
+	}
+
+	id := testutil.RandomContainerID()
+	runWithID := func(script string) {
+		spec := testutil.NewSpecWithArgs("/bin/sh", "-c", script)
+		_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+		if err != nil {
+			t.Fatalf("error setting up container: %v", err)
+		}
+		defer cleanup()
+
+		args := Args{
+			ID:        id,
+			Spec:      spec,
+			BundleDir: bundleDir,
+			Attached:  true,
+		}
+		ws, err := Run(conf, args)
+		if err != nil {
+			t.Fatalf("running container: %v", err)
+		}
+		if !ws.Exited() || ws.ExitStatus() != 0 {
+			t.Fatalf("container %q failed, waitStatus: %v", script, ws)
+		}
+	}
+
+	runWithID(fmt.Sprintf("echo upper > %s && rm %s", upperFile, lowerFile))
+
+	// The host filesystem is unchanged, and the removed file is marked with a
+	// whiteout in the upper layer.
+	if _, err := os.Stat(lowerFile); err != nil {
+		t.Errorf("lower layer file was modified: %v", err)
+	}
+	if _, err := os.Stat(upperFile); !os.IsNotExist(err) {
+		t.Errorf("upper layer file was created on the lower layer: %v", err)
+	}
+	var stat unix.Stat_t
+	whiteout := path.Join(upperDir, id, lowerFile)
+	if err := unix.Lstat(whiteout, &stat); err != nil {
+		t.Fatalf("unix.Lstat(%q): %v", whiteout, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFCHR || stat.Rdev != 0 {
+		t.Errorf("%q is not a whiteout, mode: %#o, rdev: %d", whiteout, stat.Mode, stat.Rdev)
+	}
+
+	// A restarted container sees the previous modifications.
+	runWithID(fmt.Sprintf("test \"$(cat %s)\" = upper && test ! -e %s", upperFile, lowerFile))
+}
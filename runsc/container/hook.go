@@ -24,7 +24,9 @@ import (
 	"time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/specutils"
 )
 
 // This file implements hooks as defined in OCI spec:
@@ -43,7 +45,7 @@ import (
 // Runs all hooks, always.
 func executeHooksBestEffort(hooks []specs.Hook, s specs.State) {
 	for _, h := range hooks {
-		if err := executeHook(h, s); err != nil {
+		if err := executeHook(h, s, hookContext{}); err != nil {
 			log.Warningf("Failure to execute hook %+v, err: %v", h, err)
 		}
 	}
@@ -51,16 +53,33 @@ func executeHooksBestEffort(hooks []specs.Hook, s specs.State) {
 
 // executeHooks executes hooks until the first one fails or they all execute.
 func executeHooks(hooks []specs.Hook, s specs.State) error {
+	return executeHooksInContext(hooks, s, hookContext{})
+}
+
+// hookContext describes where a hook is executed. The zero value executes the
+// hook in the runtime namespaces.
+type hookContext struct {
+	// namespaces are joined by the hook process before it's executed.
+	namespaces []specs.LinuxNamespace
+
+	// root, if set, is the directory the hook process is chrooted to. The
+	// hook's path is resolved relative to it.
+	root string
+}
+
+// executeHooksInContext executes hooks in the given context until the first
+// one fails or they all execute.
+func executeHooksInContext(hooks []specs.Hook, s specs.State, hc hookContext) error {
 	for _, h := range hooks {
-		if err := executeHook(h, s); err != nil {
+		if err := executeHook(h, s, hc); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func executeHook(h specs.Hook, s specs.State) error {
-	log.Debugf("Executing hook %+v, state: %+v", h, s)
+func executeHook(h specs.Hook, s specs.State, hc hookContext) error {
+	log.Debugf("Executing hook %+v, state: %+v, namespaces: %+v, root: %q", h, s, hc.namespaces, hc.root)
 
 	if strings.TrimSpace(h.Path) == "" {
 		return fmt.Errorf("empty path for hook")
@@ -82,7 +101,15 @@ func executeHook(h specs.Hook, s specs.State) error {
 		Stdout: &stdout,
 		Stderr: &stderr,
 	}
-	if err := cmd.Start(); err != nil {
+	if hc.root != "" {
+		cmd.Dir = "/"
+		cmd.SysProcAttr = &unix.SysProcAttr{Chroot: hc.root}
+	}
+	if len(hc.namespaces) > 0 {
+		if err := specutils.StartInNS(&cmd, hc.namespaces); err != nil {
+			return fmt.Errorf("failure starting hook %q in namespaces: %v", h.Path, err)
+		}
+	} else if err := cmd.Start(); err != nil {
 		return err
 	}
 
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -357,6 +358,78 @@ func TestMultiPIDNSPath(t *testing.T) {
 	}
 }
 
+// TestMultiPIDNSSandboxPath checks that subcontainers that join the PID
+// namespace of the sandbox process, as in pods that share a process
+// namespace, run in the root container's PID namespace.
+func TestMultiPIDNSSandboxPath(t *testing.T) {
+	for name, conf := range configs(t, false /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			rootDir, cleanup, err := testutil.SetupRootDir()
+			if err != nil {
+				t.Fatalf("error creating root dir: %v", err)
+			}
+			defer cleanup()
+			conf.RootDir = rootDir
+
+			// Setup the containers.
+			sleep := []string{"sleep", "100"}
+			testSpecs, ids := createSpecs(sleep, sleep, sleep)
+			for _, spec := range testSpecs {
+				spec.Linux = &specs.Linux{
+					Namespaces: []specs.LinuxNamespace{
+						{
+							Type: "pid",
+						},
+					},
+				}
+			}
+
+			// Start the root container first to learn the sandbox's PID.
+			containers, cleanup, err := startContainers(conf, testSpecs[:1], ids[:1])
+			if err != nil {
+				t.Fatalf("error starting containers: %v", err)
+			}
+			defer cleanup()
+			testSpecs[1].Linux.Namespaces[0].Path = fmt.Sprintf("/proc/%d/ns/pid", containers[0].Sandbox.Getpid())
+			subs, cleanup, err := startContainers(conf, testSpecs[1:], ids[1:])
+			if err != nil {
+				t.Fatalf("error starting containers: %v", err)
+			}
+			defer cleanup()
+			containers = append(containers, subs...)
+
+			// Container 1 shares the root container's PID namespace and can see
+			// all processes.
+			expectedPL := []*control.Process{
+				newProcessBuilder().PID(1).Cmd("sleep").Process(),
+				newProcessBuilder().PID(2).Cmd("sleep").Process(),
+				newProcessBuilder().PID(3).Cmd("sleep").Process(),
+				newProcessBuilder().Cmd("ps").Process(),
+			}
+			got, err := execPS(conf, containers[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !procListsEqual(got, expectedPL) {
+				t.Errorf("container got process list: %s, want: %s", procListToString(got), procListToString(expectedPL))
+			}
+
+			// Container 2 runs on its own namespace.
+			expectedPL = []*control.Process{
+				newProcessBuilder().PID(1).Cmd("sleep").Process(),
+				newProcessBuilder().Cmd("ps").Process(),
+			}
+			got, err = execPS(conf, containers[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !procListsEqual(got, expectedPL) {
+				t.Errorf("container got process list: %s, want: %s", procListToString(got), procListToString(expectedPL))
+			}
+		})
+	}
+}
+
 // TestMultiPIDNSKill kills processes using PID when containers are using
 // different PID namespaces to ensure PID is taken from the root namespace.
 func TestMultiPIDNSKill(t *testing.T) {
@@ -2039,6 +2112,16 @@ func TestMultiContainerEvent(t *testing.T) {
 		if exited := ret.ContainerUsage[containers[2].ID]; exited != 0 {
 			t.Errorf("Exited container should report 0 CPU usage, got: %d", exited)
 		}
+
+		// All containers share the sandbox network namespace, which has only a
+		// loopback interface.
+		var names []string
+		for _, iface := range evt.Data.NetworkInterfaces {
+			names = append(names, iface.Name)
+		}
+		if want := []string{"lo"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("Wrong network interfaces, cid: %q, want: %v, got: %v", cont.ID, want, names)
+		}
 	}
 
 	// Check that CPU reported by busy container is higher than sleep.
@@ -2212,3 +2295,86 @@ func TestMultiContainerShm(t *testing.T) {
 		t.Fatalf("wrong output, want: %q, got: %v", want, out)
 	}
 }
+
+// TestMultiContainerPauseResume checks that pausing a container only stops
+// its own processes, and that signals sent to it while paused are delivered
+// once it is resumed.
+func TestMultiContainerPauseResume(t *testing.T) {
+	for name, conf := range configs(t, true /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			rootDir, cleanup, err := testutil.SetupRootDir()
+			if err != nil {
+				t.Fatalf("error creating root dir: %v", err)
+			}
+			defer cleanup()
+			conf.RootDir = rootDir
+
+			tmpDir, err := ioutil.TempDir(testutil.TmpDir(), "pause")
+			if err != nil {
+				t.Fatalf("error creating temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			// Each container keeps touching a file to indicate it's running.
+			rootRunning := path.Join(tmpDir, "root")
+			subRunning := path.Join(tmpDir, "sub")
+			loop := "while [[ true ]]; do touch %q; sleep 0.1; done"
+			specs, ids := createSpecs(
+				[]string{"/bin/bash", "-c", fmt.Sprintf(loop, rootRunning)},
+				[]string{"/bin/bash", "-c", fmt.Sprintf(loop, subRunning)})
+			containers, cleanup, err := startContainers(conf, specs, ids)
+			if err != nil {
+				t.Fatalf("error starting containers: %v", err)
+			}
+			defer cleanup()
+			root, sub := containers[0], containers[1]
+
+			for _, f := range []string{rootRunning, subRunning} {
+				if err := waitForFileExist(f); err != nil {
+					t.Fatalf("error waiting for container to start: %v", err)
+				}
+			}
+
+			if err := sub.Pause(); err != nil {
+				t.Fatalf("error pausing container: %v", err)
+			}
+			if got, want := sub.Status, Paused; got != want {
+				t.Errorf("container status got %v, want %v", got, want)
+			}
+			if got, want := root.Status, Running; got != want {
+				t.Errorf("root container status got %v, want %v", got, want)
+			}
+
+			for _, f := range []string{rootRunning, subRunning} {
+				if err := os.Remove(f); err != nil {
+					t.Fatalf("os.Remove(%q) failed: %v", f, err)
+				}
+			}
+			// The root container must keep running.
+			if err := waitForFileExist(rootRunning); err != nil {
+				t.Fatalf("root container was paused: %v", err)
+			}
+			if _, err := os.Stat(subRunning); !os.IsNotExist(err) {
+				t.Fatalf("container did not pause: file exist check: %v", err)
+			}
+
+			// Signals are queued while the container is paused.
+			if err := sub.SignalContainer(unix.SIGKILL, false); err != nil {
+				t.Fatalf("error signaling paused container: %v", err)
+			}
+			time.Sleep(200 * time.Millisecond)
+			if _, err := os.Stat(subRunning); !os.IsNotExist(err) {
+				t.Fatalf("container did not stay paused: file exist check: %v", err)
+			}
+
+			if err := sub.Resume(); err != nil {
+				t.Fatalf("error resuming container: %v", err)
+			}
+			if ws, err := sub.Wait(); err != nil {
+				t.Fatalf("error waiting for container: %v", err)
+			} else if !ws.Signaled() || ws.Signal() != unix.SIGKILL {
+				t.Errorf("container exited with %v, want SIGKILL", ws)
+			}
+		})
+	}
+}
@@ -24,7 +24,6 @@ import (
 	"strings"
 
 	"github.com/gofrs/flock"
-	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sync"
 )
@@ -87,21 +86,7 @@ func Load(rootDir string, id FullID, opts LoadOpts) (*Container, error) {
 	}
 
 	if !opts.SkipCheck {
-		// If the status is "Running" or "Created", check that the sandbox/container
-		// is still running, setting it to Stopped if not.
-		//
-		// This is inherently racy.
-		switch c.Status {
-		case Created:
-			if !c.IsSandboxRunning() {
-				// Sandbox no longer exists, so this container definitely does not exist.
-				c.changeStatus(Stopped)
-			}
-		case Running:
-			if err := c.SignalContainer(unix.Signal(0), false); err != nil {
-				c.changeStatus(Stopped)
-			}
-		}
+		c.RefreshStatus()
 	}
 
 	return c, nil
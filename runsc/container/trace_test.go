@@ -31,6 +31,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/seccheck/sinks/remote/test"
 	"gvisor.dev/gvisor/pkg/test/testutil"
 	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/boot/procfs"
 )
 
 func remoteSinkConfig(endpoint string) seccheck.SinkConfig {
@@ -193,9 +194,13 @@ func TestTraceLifecycle(t *testing.T) {
 		t.Errorf("wrong session, want: %v, got: %v", seccheck.DefaultSessionName, got)
 	}
 
-	if err := cont.Sandbox.DeleteTraceSession("Default"); err != nil {
+	deleted, err := cont.Sandbox.DeleteTraceSession("Default")
+	if err != nil {
 		t.Fatalf("DeleteTraceSession(): %v", err)
 	}
+	if len(deleted.Sinks) != 1 || deleted.Sinks[0].Status.DroppedCount != 0 {
+		t.Errorf("wrong status for deleted session, want a single sink with no dropped points, got: %+v", deleted)
+	}
 
 	// Check that session was indeed deleted.
 	if sessions, err := cont.Sandbox.ListTraceSessions(); err != nil {
@@ -450,3 +455,93 @@ func TestProcfsDump(t *testing.T) {
 		}
 	}
 }
+
+func TestFDsDump(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	spec.Process.Cwd = "/tmp"
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	out, err := ioutil.TempFile(testutil.TmpDir(), "fds")
+	if err != nil {
+		t.Fatalf("error creating output file: %v", err)
+	}
+	defer out.Close()
+	if err := cont.Sandbox.FDsDump(out); err != nil {
+		t.Fatalf("FDsDump() failed: %v", err)
+	}
+	if _, err := out.Seek(0, 0); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+
+	var (
+		task   *procfs.TaskFilesInfo
+		mounts *procfs.MountsInfo
+		fds    = make(map[int32]*procfs.FDDetails)
+	)
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var rec procfs.FDsDumpRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("error decoding dump: %v", err)
+		}
+		switch {
+		case rec.Task != nil:
+			task = rec.Task
+		case rec.Mounts != nil:
+			mounts = rec.Mounts
+		case rec.FD != nil:
+			fds[rec.FD.Number] = rec.FD
+		default:
+			t.Errorf("empty record in dump")
+		}
+	}
+
+	// Sleep should be the only task running in the container.
+	if task == nil {
+		t.Fatalf("no task in dump")
+	}
+	if task.PID != 1 || task.TID != 1 {
+		t.Errorf("got PID %d, TID %d, want 1, 1", task.PID, task.TID)
+	}
+	if task.CWD != "/tmp" {
+		t.Errorf("got CWD %q, want /tmp", task.CWD)
+	}
+	if task.Root != "/" {
+		t.Errorf("got root %q, want /", task.Root)
+	}
+	if mounts == nil || mounts.MountNamespace != task.MountNamespace || len(mounts.MountInfo) == 0 {
+		t.Errorf("missing mount table for mount namespace %d: %+v", task.MountNamespace, mounts)
+	}
+	for i := int32(0); i < 3; i++ {
+		fd, ok := fds[i]
+		if !ok {
+			t.Errorf("FD %d missing from dump", i)
+			continue
+		}
+		if fd.TID != 1 {
+			t.Errorf("FD %d: got TID %d, want 1", i, fd.TID)
+		}
+		if fd.Refs < 1 {
+			t.Errorf("FD %d: got refs %d, want >= 1", i, fd.Refs)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// delegationWatchMask is the set of inotify events that recall a delegation
+// on a directory. Access events are omitted, so atimes are not kept coherent.
+const delegationWatchMask = unix.IN_ATTRIB | unix.IN_CREATE | unix.IN_DELETE | unix.IN_DELETE_SELF | unix.IN_MODIFY | unix.IN_MOVE_SELF | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+
+// delegationWatcher uses inotify to recall delegations on directories when
+// they change.
+type delegationWatcher struct {
+	// initOnce initializes inotifyFD and initErr.
+	initOnce sync.Once
+	initErr  error
+
+	// inotifyFD is the inotify instance holding all watches. It is immutable
+	// once initialized.
+	inotifyFD int
+
+	mu sync.Mutex
+	// watches maps inotify watch descriptors to the control FDs watched by
+	// them. Control FDs on the same directory share a watch descriptor.
+	// watches is protected by mu.
+	watches map[int32]map[*controlFDLisa]struct{}
+}
+
+func (w *delegationWatcher) init() error {
+	w.initOnce.Do(func() {
+		fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+		if err != nil {
+			w.initErr = err
+			return
+		}
+		w.inotifyFD = fd
+		w.watches = make(map[int32]map[*controlFDLisa]struct{})
+		go w.run() // S/R-SAFE: gofer is not saved.
+	})
+	return w.initErr
+}
+
+// watch starts watching the directory backing fd, unless it is already
+// watched.
+func (w *delegationWatcher) watch(fd *controlFDLisa) error {
+	if err := w.init(); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if fd.watchDesc >= 0 {
+		return nil
+	}
+	// inotify_add_watch(2) only takes a path, and the gofer's root doesn't
+	// have /proc, so watch the directory through the working directory. All
+	// other gofer operations use paths relative to FDs, so the working
+	// directory isn't otherwise relied upon; w.mu serializes its use here.
+	if err := unix.Fchdir(fd.hostFD); err != nil {
+		return err
+	}
+	wd, err := unix.InotifyAddWatch(w.inotifyFD, ".", delegationWatchMask)
+	if err != nil {
+		return err
+	}
+	fd.watchDesc = int32(wd)
+	fds, ok := w.watches[fd.watchDesc]
+	if !ok {
+		fds = make(map[*controlFDLisa]struct{})
+		w.watches[fd.watchDesc] = fds
+	}
+	fds[fd] = struct{}{}
+	return nil
+}
+
+// unwatch stops watching the directory backing fd.
+func (w *delegationWatcher) unwatch(fd *controlFDLisa) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if fd.watchDesc < 0 {
+		return
+	}
+	fds := w.watches[fd.watchDesc]
+	delete(fds, fd)
+	if len(fds) == 0 {
+		delete(w.watches, fd.watchDesc)
+		// This fails if the watch was already removed because the directory
+		// was deleted, which is fine.
+		_, _ = unix.InotifyRmWatch(w.inotifyFD, uint32(fd.watchDesc))
+	}
+	fd.watchDesc = -1
+}
+
+// run reads inotify events and recalls the delegations on the directories
+// they concern.
+func (w *delegationWatcher) run() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := unix.Read(w.inotifyFD, buf)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			log.Warningf("Reading inotify events failed, delegations are no longer recalled: %v", err)
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			wd := int32(hostarch.ByteOrder.Uint32(buf[off:]))
+			mask := hostarch.ByteOrder.Uint32(buf[off+4:])
+			nameLen := hostarch.ByteOrder.Uint32(buf[off+12:])
+			off += unix.SizeofInotifyEvent + int(nameLen)
+			w.recall(wd, mask)
+		}
+	}
+}
+
+// recall recalls the delegations affected by an inotify event.
+func (w *delegationWatcher) recall(wd int32, mask uint32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		// Events were lost, so any directory may have changed.
+		for _, fds := range w.watches {
+			for fd := range fds {
+				fd.RecallDelegation()
+			}
+		}
+		return
+	}
+	fds := w.watches[wd]
+	for fd := range fds {
+		fd.RecallDelegation()
+	}
+	if mask&unix.IN_IGNORED != 0 {
+		// The watch was removed because the directory was deleted.
+		for fd := range fds {
+			fd.watchDesc = -1
+		}
+		delete(w.watches, wd)
+	}
+}
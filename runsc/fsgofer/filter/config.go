@@ -27,8 +27,18 @@ var allowedSyscalls = seccomp.SyscallRules{
 	unix.SYS_ACCEPT:        {},
 	unix.SYS_CLOCK_GETTIME: {},
 	unix.SYS_CLOSE:         {},
-	unix.SYS_DUP:           {},
-	unix.SYS_EPOLL_CTL:     {},
+	unix.SYS_COPY_FILE_RANGE: []seccomp.Rule{
+		{
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.EqualTo(0),
+		},
+	},
+	unix.SYS_DUP:       {},
+	unix.SYS_EPOLL_CTL: {},
 	unix.SYS_EPOLL_PWAIT: []seccomp.Rule{
 		{
 			seccomp.MatchAny{},
@@ -51,7 +61,32 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.MatchAny{},
 			seccomp.EqualTo(0),
 		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_KEEP_SIZE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_PUNCH_HOLE | unix.FALLOC_FL_KEEP_SIZE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_ZERO_RANGE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_ZERO_RANGE | unix.FALLOC_FL_KEEP_SIZE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_COLLAPSE_RANGE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_INSERT_RANGE),
+		},
 	},
+	unix.SYS_FCHDIR:   {}, // Used to add inotify watches on directories.
 	unix.SYS_FCHMOD:   {},
 	unix.SYS_FCHMODAT: {},
 	unix.SYS_FCHOWNAT: {},
@@ -116,17 +151,24 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.EqualTo(0),
 		},
 	},
-	unix.SYS_GETDENTS64:   {},
-	unix.SYS_GETPID:       {},
-	unix.SYS_GETRANDOM:    {},
-	unix.SYS_GETTID:       {},
-	unix.SYS_GETTIMEOFDAY: {},
-	unix.SYS_LINKAT:       {},
-	unix.SYS_LSEEK:        {},
-	unix.SYS_MADVISE:      {},
-	unix.SYS_MEMFD_CREATE: {}, /// Used by flipcall.PacketWindowAllocator.Init().
-	unix.SYS_MKDIRAT:      {},
-	unix.SYS_MKNODAT:      {},
+	unix.SYS_GETDENTS64:        {},
+	unix.SYS_GETPID:            {},
+	unix.SYS_GETRANDOM:         {},
+	unix.SYS_GETTID:            {},
+	unix.SYS_GETTIMEOFDAY:      {},
+	unix.SYS_INOTIFY_ADD_WATCH: {},
+	unix.SYS_INOTIFY_INIT1: []seccomp.Rule{
+		{
+			seccomp.EqualTo(unix.IN_CLOEXEC),
+		},
+	},
+	unix.SYS_INOTIFY_RM_WATCH: {},
+	unix.SYS_LINKAT:           {},
+	unix.SYS_LSEEK:            {},
+	unix.SYS_MADVISE:          {},
+	unix.SYS_MEMFD_CREATE:     {}, /// Used by flipcall.PacketWindowAllocator.Init().
+	unix.SYS_MKDIRAT:          {},
+	unix.SYS_MKNODAT:          {},
 	unix.SYS_MMAP: []seccomp.Rule{
 		{
 			seccomp.MatchAny{},
@@ -147,8 +189,18 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.EqualTo(unix.MAP_PRIVATE | unix.MAP_ANONYMOUS | unix.MAP_FIXED),
 		},
 	},
-	unix.SYS_MPROTECT:   {},
-	unix.SYS_MUNMAP:     {},
+	unix.SYS_MPROTECT: {},
+	unix.SYS_MUNMAP:   {},
+	// Used by fsgofer.controlFDLisa.NameToHandle().
+	unix.SYS_NAME_TO_HANDLE_AT: []seccomp.Rule{
+		{
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.AT_EMPTY_PATH),
+		},
+	},
 	unix.SYS_NANOSLEEP:  {},
 	unix.SYS_OPENAT:     {},
 	unix.SYS_PPOLL:      {},
@@ -201,6 +253,14 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.EqualTo(0),
 		},
 	},
+	// Used by fsgofer.fstatTo() to get file creation times.
+	unix.SYS_STATX: []seccomp.Rule{
+		{
+			seccomp.MatchAny{},
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.AT_EMPTY_PATH | unix.AT_SYMLINK_NOFOLLOW),
+		},
+	},
 	unix.SYS_SYMLINKAT: {},
 	unix.SYS_TGKILL: []seccomp.Rule{
 		{
@@ -243,6 +303,8 @@ var udsCreateSyscalls = seccomp.SyscallRules{
 }
 
 var xattrSyscalls = seccomp.SyscallRules{
-	unix.SYS_FGETXATTR: {},
-	unix.SYS_FSETXATTR: {},
+	unix.SYS_FGETXATTR:    {},
+	unix.SYS_FLISTXATTR:   {},
+	unix.SYS_FREMOVEXATTR: {},
+	unix.SYS_FSETXATTR:    {},
 }
@@ -27,6 +27,14 @@ type Options struct {
 	UDSOpenEnabled   bool
 	UDSCreateEnabled bool
 	ProfileEnabled   bool
+
+	// OverlayUpperEnabled is set if the gofer serves the upper layer of an
+	// overlay, which requires access to extended attributes.
+	OverlayUpperEnabled bool
+
+	// XattrsEnabled is set if extended attributes are passed through to the
+	// host.
+	XattrsEnabled bool
 }
 
 // Install installs seccomp filters.
@@ -49,6 +57,10 @@ func Install(opt Options) error {
 		}
 	}
 
+	if opt.OverlayUpperEnabled || opt.XattrsEnabled {
+		s.Merge(xattrSyscalls)
+	}
+
 	// Set of additional filters used by -race and -msan. Returns empty
 	// when not enabled.
 	s.Merge(instrumentationFilters())
@@ -68,6 +68,26 @@ type Config struct {
 
 	// HostFifo signals whether the gofer can connect to host FIFOs.
 	HostFifo config.HostFifo
+
+	// DirectFS signals whether the gofer may donate host FDs for files on
+	// read-only mounts to the client. Only supported by lisafs.
+	DirectFS bool
+
+	// OverlayUpper signals that the mount is the upper layer of an overlay in
+	// the sandbox. This allows creating whiteouts and accessing overlay
+	// extended attributes, which are otherwise not supported. Only supported
+	// by lisafs.
+	OverlayUpper bool
+
+	// Xattrs signals that extended attributes in the "user" and "trusted"
+	// namespaces and file capabilities ("security.capability") are passed
+	// through to the host. Only supported by lisafs.
+	Xattrs bool
+
+	// MountFD is a host FD for the root of the mount. It is used instead of
+	// the mount path if OverlayUpper is true, since the upper layer's host
+	// directory is not reachable from within the gofer's chroot.
+	MountFD int
 }
 
 type attachPoint struct {
@@ -21,6 +21,7 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -32,10 +33,28 @@ import (
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 )
 
+const (
+	// overlayXattrPrefix is the prefix of extended attributes used by the
+	// sandbox's overlay.
+	overlayXattrPrefix = linux.XATTR_TRUSTED_PREFIX + "overlay."
+
+	// hostOverlayXattrPrefix is the prefix of the host extended attributes
+	// that store overlay extended attributes.
+	hostOverlayXattrPrefix = linux.XATTR_USER_PREFIX + "overlay."
+
+	// hostXattrPrefix is the prefix of the host extended attributes that
+	// store the sandbox's "trusted" extended attributes and file
+	// capabilities.
+	hostXattrPrefix = linux.XATTR_USER_PREFIX + "gvisor."
+)
+
 // LisafsServer implements lisafs.ServerImpl for fsgofer.
 type LisafsServer struct {
 	lisafs.Server
 	config Config
+
+	// delegations recalls delegations granted on all connections.
+	delegations delegationWatcher
 }
 
 var _ lisafs.ServerImpl = (*LisafsServer)(nil)
@@ -54,9 +73,15 @@ func NewLisafsServer(config Config) *LisafsServer {
 // Mount implements lisafs.ServerImpl.Mount.
 func (s *LisafsServer) Mount(c *lisafs.Connection, mountNode *lisafs.Node) (*lisafs.ControlFD, linux.Statx, error) {
 	mountPath := mountNode.FilePath()
-	rootHostFD, err := tryOpen(func(flags int) (int, error) {
+	open := func(flags int) (int, error) {
 		return unix.Open(mountPath, flags, 0)
-	})
+	}
+	if s.config.OverlayUpper {
+		open = func(flags int) (int, error) {
+			return unix.Openat(s.config.MountFD, ".", flags, 0)
+		}
+	}
+	rootHostFD, err := tryOpen(open)
 	if err != nil {
 		return nil, linux.Statx{}, err
 	}
@@ -79,6 +104,7 @@ func (s *LisafsServer) Mount(c *lisafs.Connection, mountNode *lisafs.Node) (*lis
 	rootFD := &controlFDLisa{
 		hostFD:         rootHostFD,
 		writableHostFD: atomicbitops.FromInt32(-1),
+		watchDesc:      -1,
 	}
 	mountNode.IncRef() // Ref is transferred to ControlFD.
 	rootFD.ControlFD.Init(c, mountNode, linux.FileMode(stat.Mode), rootFD)
@@ -92,8 +118,9 @@ func (s *LisafsServer) MaxMessageSize() uint32 {
 
 // SupportedMessages implements lisafs.ServerImpl.SupportedMessages.
 func (s *LisafsServer) SupportedMessages() []lisafs.MID {
-	// Note that Flush, FListXattr and FRemoveXattr are not supported.
-	return []lisafs.MID{
+	// Note that Flush is not supported, and FListXattr and FRemoveXattr are
+	// only supported if extended attributes are enabled.
+	supported := []lisafs.MID{
 		lisafs.Mount,
 		lisafs.Channel,
 		lisafs.FStat,
@@ -122,7 +149,19 @@ func (s *LisafsServer) SupportedMessages() []lisafs.MID {
 		lisafs.BindAt,
 		lisafs.Listen,
 		lisafs.Accept,
+		lisafs.Delegate,
+		lisafs.WaitRecall,
+		lisafs.CopyFileRange,
+		lisafs.OpenTmpfileAt,
+		lisafs.NameToHandle,
+	}
+	if s.config.DirectFS {
+		supported = append(supported, lisafs.DonatePathFD)
 	}
+	if s.config.OverlayUpper || s.config.Xattrs {
+		supported = append(supported, lisafs.FListXattr, lisafs.FRemoveXattr)
+	}
+	return supported
 }
 
 // controlFDLisa implements lisafs.ControlFDImpl.
@@ -136,9 +175,16 @@ type controlFDLisa struct {
 	// the same FD as `hostFD`. It is initialized to -1, and can change in value
 	// exactly once.
 	writableHostFD atomicbitops.Int32
+
+	// watchDesc is the inotify watch descriptor used to recall delegations on
+	// this directory, or -1 if there is none. It is protected by
+	// LisafsServer.delegations.mu.
+	watchDesc int32
 }
 
 var _ lisafs.ControlFDImpl = (*controlFDLisa)(nil)
+var _ lisafs.PathFDDonator = (*controlFDLisa)(nil)
+var _ lisafs.Delegator = (*controlFDLisa)(nil)
 
 func newControlFDLisa(hostFD int, parent *controlFDLisa, name string, mode linux.FileMode) *controlFDLisa {
 	var (
@@ -168,10 +214,28 @@ func newControlFDLisa(hostFD int, parent *controlFDLisa, name string, mode linux
 	})
 	childFD.hostFD = hostFD
 	childFD.writableHostFD = atomicbitops.FromInt32(-1)
+	childFD.watchDesc = -1
 	childFD.ControlFD.Init(parent.Conn(), childNode, mode, childFD)
 	return childFD
 }
 
+// newUnnamedControlFDLisa is like newControlFDLisa, but for a regular file
+// that has no name in parent, such as one created with O_TMPFILE.
+func newUnnamedControlFDLisa(hostFD int, parent *controlFDLisa) *controlFDLisa {
+	// See newControlFDLisa for why node and control FD are allocated together.
+	temp := struct {
+		node lisafs.Node
+		fd   controlFDLisa
+	}{}
+	childFD := &temp.fd
+	temp.node.InitUnnamed(parent.Node())
+	childFD.hostFD = hostFD
+	childFD.writableHostFD = atomicbitops.FromInt32(-1)
+	childFD.watchDesc = -1
+	childFD.ControlFD.Init(parent.Conn(), &temp.node, linux.ModeRegular, childFD)
+	return childFD
+}
+
 func (fd *controlFDLisa) getWritableFD() (int, error) {
 	if writableFD := fd.writableHostFD.Load(); writableFD != -1 {
 		return int(writableFD), nil
@@ -199,6 +263,7 @@ func (fd *controlFDLisa) FD() *lisafs.ControlFD {
 
 // Close implements lisafs.ControlFDImpl.Close.
 func (fd *controlFDLisa) Close() {
+	fd.Conn().ServerImpl().(*LisafsServer).delegations.unwatch(fd)
 	if fd.hostFD >= 0 {
 		_ = unix.Close(fd.hostFD)
 		fd.hostFD = -1
@@ -210,6 +275,38 @@ func (fd *controlFDLisa) Close() {
 	}
 }
 
+// PathFD implements lisafs.PathFDDonator.PathFD.
+func (fd *controlFDLisa) PathFD() (int, error) {
+	// Donate a duplicate so that the control FD stays usable. Depending on
+	// tryOpen, hostFD is either read-only or O_PATH; both are fine for the
+	// path-based syscalls the client makes with it.
+	return unix.FcntlInt(uintptr(fd.hostFD), unix.F_DUPFD_CLOEXEC, 0)
+}
+
+// Delegate implements lisafs.Delegator.Delegate.
+func (fd *controlFDLisa) Delegate() error {
+	// The watch stays in place until fd is closed, so that delegations granted
+	// again after a recall are covered too.
+	return fd.Conn().ServerImpl().(*LisafsServer).delegations.watch(fd)
+}
+
+// NameToHandle implements lisafs.HandleEncoder.NameToHandle.
+func (fd *controlFDLisa) NameToHandle() (linux.Statx, int32, []byte, error) {
+	stat, err := fstatTo(fd.hostFD)
+	if err != nil {
+		return linux.Statx{}, 0, nil, err
+	}
+	// Some host filesystems (e.g. overlay2 without nfs_export) do not support
+	// file handles, in which case the device and inode numbers are all the
+	// client gets to identify the file.
+	handle, _, err := unix.NameToHandleAt(fd.hostFD, "", unix.AT_EMPTY_PATH)
+	if err != nil {
+		log.Debugf("name_to_handle_at(%d) failed, only returning device and inode numbers: %v", fd.hostFD, err)
+		return stat, 0, nil, nil
+	}
+	return stat, handle.Type(), handle.Bytes(), nil
+}
+
 // Stat implements lisafs.ControlFDImpl.Stat.
 func (fd *controlFDLisa) Stat() (linux.Statx, error) {
 	return fstatTo(fd.hostFD)
@@ -493,6 +590,86 @@ func (fd *controlFDLisa) OpenCreate(mode linux.FileMode, uid lisafs.UID, gid lis
 	return childFD.FD(), childStat, newFD.FD(), hostOpenFD, nil
 }
 
+// tmpfileCounter is used to generate names for unnamed files created by
+// createUnlinked.
+var tmpfileCounter atomicbitops.Uint64
+
+// OpenTmpfile implements lisafs.ControlFDImpl.OpenTmpfile.
+func (fd *controlFDLisa) OpenTmpfile(mode linux.FileMode, uid lisafs.UID, gid lisafs.GID, flags uint32) (*lisafs.ControlFD, linux.Statx, *lisafs.OpenFD, int, error) {
+	perm := uint32(mode &^ linux.FileTypeMask)
+	// The host FD backing the control FD must be writable, as O_TMPFILE
+	// requires. O_EXCL is passed through so that the host prevents linking.
+	createFlags := unix.O_TMPFILE | unix.O_RDWR | unix.O_NONBLOCK | openFlags | int(flags&unix.O_EXCL)
+	childHostFD, err := unix.Openat(fd.hostFD, ".", createFlags, perm)
+	if err == unix.EOPNOTSUPP || err == unix.EISDIR {
+		// The host filesystem does not support O_TMPFILE; kernels that predate
+		// it fail with EISDIR. Create a named file and unlink it right away
+		// instead. Such a file can not be linked back into the filesystem, in
+		// which case Link fails with ENOENT.
+		childHostFD, err = fd.createUnlinked(perm)
+	}
+	if err != nil {
+		return nil, linux.Statx{}, nil, -1, err
+	}
+
+	cu := cleanup.Make(func() {
+		unix.Close(childHostFD)
+	})
+	defer cu.Clean()
+
+	// Set the owners as requested by the client.
+	if err := unix.Fchownat(childHostFD, "", int(uid), int(gid), unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return nil, linux.Statx{}, nil, -1, err
+	}
+
+	// Get stat results.
+	childStat, err := fstatTo(childHostFD)
+	if err != nil {
+		return nil, linux.Statx{}, nil, -1, err
+	}
+
+	// Now open an FD to the newly created file with the flags requested by the client.
+	flags = (flags &^ unix.O_EXCL) | openFlags
+	newHostFD, err := unix.Openat(int(procSelfFD.FD()), strconv.Itoa(childHostFD), int(flags)&^unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, linux.Statx{}, nil, -1, err
+	}
+	cu.Release()
+
+	childFD := newUnnamedControlFDLisa(childHostFD, fd)
+	newFD := childFD.newOpenFDLisa(newHostFD, uint32(flags))
+
+	// Donate FD for the same reasons as OpenCreate.
+	hostOpenFD := -1
+	if dupFD, err := unix.Dup(newFD.hostFD); err == nil {
+		hostOpenFD = dupFD
+	}
+
+	return childFD.FD(), childStat, newFD.FD(), hostOpenFD, nil
+}
+
+// createUnlinked creates a regular file in the directory represented by fd
+// and unlinks it, returning a read-write host FD for the file.
+func (fd *controlFDLisa) createUnlinked(perm uint32) (int, error) {
+	createFlags := unix.O_CREAT | unix.O_EXCL | unix.O_RDWR | unix.O_NONBLOCK | openFlags
+	for {
+		name := ".gvisor.tmpfile." + strconv.Itoa(os.Getpid()) + "." + strconv.FormatUint(tmpfileCounter.Add(1), 10)
+		hostFD, err := unix.Openat(fd.hostFD, name, createFlags, perm)
+		if err == unix.EEXIST {
+			continue
+		}
+		if err != nil {
+			return -1, err
+		}
+		if err := unix.Unlinkat(fd.hostFD, name, 0); err != nil {
+			log.Warningf("error unlinking file %q: %v", path.Join(fd.Node().FilePath(), name), err)
+			unix.Close(hostFD)
+			return -1, err
+		}
+		return hostFD, nil
+	}
+}
+
 // Mkdir implements lisafs.ControlFDImpl.Mkdir.
 func (fd *controlFDLisa) Mkdir(mode linux.FileMode, uid lisafs.UID, gid lisafs.GID, name string) (*lisafs.ControlFD, linux.Statx, error) {
 	if err := unix.Mkdirat(fd.hostFD, name, uint32(mode&^linux.FileTypeMask)); err != nil {
@@ -534,7 +711,7 @@ func (fd *controlFDLisa) Mknod(mode linux.FileMode, uid lisafs.UID, gid lisafs.G
 	// From mknod(2) man page:
 	// "EPERM: [...] if the filesystem containing pathname does not support
 	// the type of node requested."
-	if mode.FileType() != linux.ModeRegular {
+	if mode.FileType() != linux.ModeRegular && !fd.isOverlayWhiteout(mode, minor, major) {
 		return nil, linux.Statx{}, unix.EPERM
 	}
 
@@ -797,22 +974,131 @@ func (fd *controlFDLisa) Renamed() {
 
 // GetXattr implements lisafs.ControlFDImpl.GetXattr.
 func (fd *controlFDLisa) GetXattr(name string, size uint32, getValueBuf func(uint32) []byte) (uint16, error) {
-	return 0, unix.EOPNOTSUPP
+	hostName, ok := fd.hostXattrName(name)
+	if !ok {
+		return 0, unix.EOPNOTSUPP
+	}
+	if size == 0 {
+		n, err := unix.Fgetxattr(fd.hostFD, hostName, nil)
+		if err != nil {
+			return 0, err
+		}
+		size = uint32(n)
+	}
+	n, err := unix.Fgetxattr(fd.hostFD, hostName, getValueBuf(size))
+	if err != nil {
+		return 0, err
+	}
+	return uint16(n), nil
 }
 
 // SetXattr implements lisafs.ControlFDImpl.SetXattr.
 func (fd *controlFDLisa) SetXattr(name string, value string, flags uint32) error {
-	return unix.EOPNOTSUPP
+	hostName, ok := fd.hostXattrName(name)
+	if !ok {
+		return unix.EOPNOTSUPP
+	}
+	return unix.Fsetxattr(fd.hostFD, hostName, []byte(value), int(flags))
 }
 
 // ListXattr implements lisafs.ControlFDImpl.ListXattr.
 func (fd *controlFDLisa) ListXattr(size uint64) (lisafs.StringArray, error) {
-	return nil, unix.EOPNOTSUPP
+	config := &fd.Conn().ServerImpl().(*LisafsServer).config
+	if !config.OverlayUpper && !config.Xattrs {
+		return nil, unix.EOPNOTSUPP
+	}
+	buf := make([]byte, linux.XATTR_LIST_MAX)
+	n, err := unix.Flistxattr(fd.hostFD, buf)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		names    lisafs.StringArray
+		listSize uint64
+	)
+	for _, hostName := range strings.Split(string(buf[:n]), "\x00") {
+		name, ok := fd.sandboxXattrName(hostName)
+		if !ok {
+			continue
+		}
+		names = append(names, name)
+		// Add one byte per null terminator.
+		listSize += uint64(len(name)) + 1
+	}
+	if size != 0 && listSize > size {
+		return nil, unix.ERANGE
+	}
+	return names, nil
 }
 
 // RemoveXattr implements lisafs.ControlFDImpl.RemoveXattr.
 func (fd *controlFDLisa) RemoveXattr(name string) error {
-	return unix.EOPNOTSUPP
+	hostName, ok := fd.hostXattrName(name)
+	if !ok {
+		return unix.EOPNOTSUPP
+	}
+	return unix.Fremovexattr(fd.hostFD, hostName)
+}
+
+// isOverlayWhiteout returns true if a file with the given mode and device
+// number is an overlay whiteout that may be created on this mount. Whiteouts
+// are 0/0 character devices, as in Linux overlayfs, which unprivileged users
+// may create since Linux 5.8.
+func (fd *controlFDLisa) isOverlayWhiteout(mode linux.FileMode, minor uint32, major uint32) bool {
+	return fd.Conn().ServerImpl().(*LisafsServer).config.OverlayUpper &&
+		mode.FileType() == linux.ModeCharacterDevice && minor == 0 && major == 0
+}
+
+// hostXattrName returns the name of the host extended attribute that stores
+// the extended attribute name on this mount, if any.
+//
+// The sandbox's overlay uses "trusted.overlay.*" attributes, like Linux
+// overlayfs. Accessing trusted attributes on the host requires CAP_SYS_ADMIN,
+// so they are stored as "user.overlay.*" attributes instead, which is what
+// Linux overlayfs uses when mounted with the "userxattr" option.
+//
+// Other "trusted" attributes and file capabilities are stored as
+// "user.gvisor.*" attributes for the same reason. This is also the case if the
+// gofer is privileged, since file capabilities stored as such on the host
+// would take effect when the file is executed on the host.
+func (fd *controlFDLisa) hostXattrName(name string) (string, bool) {
+	config := &fd.Conn().ServerImpl().(*LisafsServer).config
+	switch {
+	case config.OverlayUpper && strings.HasPrefix(name, overlayXattrPrefix):
+		return hostOverlayXattrPrefix + strings.TrimPrefix(name, overlayXattrPrefix), true
+	case !config.Xattrs:
+		return "", false
+	case strings.HasPrefix(name, linux.XATTR_USER_PREFIX):
+		// Host attributes that store other attributes are hidden from the
+		// sandbox, so that it can't forge them.
+		if strings.HasPrefix(name, hostXattrPrefix) || (config.OverlayUpper && strings.HasPrefix(name, hostOverlayXattrPrefix)) {
+			return "", false
+		}
+		return name, true
+	case strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) || name == linux.XATTR_NAME_CAPS:
+		return hostXattrPrefix + name, true
+	default:
+		return "", false
+	}
+}
+
+// sandboxXattrName is the inverse of hostXattrName. It returns false if the
+// host extended attribute hostName is not visible to the sandbox.
+func (fd *controlFDLisa) sandboxXattrName(hostName string) (string, bool) {
+	config := &fd.Conn().ServerImpl().(*LisafsServer).config
+	switch {
+	case config.OverlayUpper && strings.HasPrefix(hostName, hostOverlayXattrPrefix):
+		return overlayXattrPrefix + strings.TrimPrefix(hostName, hostOverlayXattrPrefix), true
+	case !config.Xattrs:
+		return "", false
+	case strings.HasPrefix(hostName, hostXattrPrefix):
+		name := strings.TrimPrefix(hostName, hostXattrPrefix)
+		return name, strings.HasPrefix(name, linux.XATTR_TRUSTED_PREFIX) || name == linux.XATTR_NAME_CAPS
+	case strings.HasPrefix(hostName, linux.XATTR_USER_PREFIX):
+		return hostName, true
+	default:
+		return "", false
+	}
 }
 
 // openFDLisa implements lisafs.OpenFDImpl.
@@ -881,6 +1167,21 @@ func (fd *openFDLisa) Allocate(mode, off, length uint64) error {
 	return unix.Fallocate(fd.hostFD, uint32(mode), int64(off), int64(length))
 }
 
+// CopyFileRange implements lisafs.OpenFDImpl.CopyFileRange.
+func (fd *openFDLisa) CopyFileRange(src lisafs.OpenFDImpl, srcOff, off, count uint64) (uint64, error) {
+	srcFD, ok := src.(*openFDLisa)
+	if !ok {
+		return 0, unix.EINVAL
+	}
+	roff := int64(srcOff)
+	woff := int64(off)
+	n, err := unix.CopyFileRange(srcFD.hostFD, &roff, fd.hostFD, &woff, int(count), 0 /* flags */)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(n), nil
+}
+
 // Flush implements lisafs.OpenFDImpl.Flush.
 func (fd *openFDLisa) Flush() error {
 	return nil
@@ -1010,12 +1311,56 @@ func tryOpen(open func(int) (int, error)) (hostFD int, err error) {
 	return
 }
 
+// statxMask is the set of fields that fstatTo requests from the host.
+const statxMask = unix.STATX_BASIC_STATS | unix.STATX_BTIME
+
 func fstatTo(hostFD int) (linux.Statx, error) {
+	var stat unix.Statx_t
+	if err := unix.Statx(hostFD, "", unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW, statxMask, &stat); err != nil {
+		if err == unix.ENOSYS {
+			// The host doesn't support statx(2).
+			return fstatToFromStat(hostFD)
+		}
+		return linux.Statx{}, err
+	}
+
+	// Only pass on fields that the host filesystem actually provided, so that
+	// the sentry doesn't report e.g. a zero creation time.
+	return linux.Statx{
+		Mask:      stat.Mask & statxMask,
+		Mode:      stat.Mode,
+		DevMinor:  stat.Dev_minor,
+		DevMajor:  stat.Dev_major,
+		Ino:       stat.Ino,
+		Nlink:     stat.Nlink,
+		UID:       stat.Uid,
+		GID:       stat.Gid,
+		RdevMinor: stat.Rdev_minor,
+		RdevMajor: stat.Rdev_major,
+		Size:      stat.Size,
+		Blksize:   stat.Blksize,
+		Blocks:    stat.Blocks,
+		Atime:     statxTimestampFromHost(stat.Atime),
+		Btime:     statxTimestampFromHost(stat.Btime),
+		Ctime:     statxTimestampFromHost(stat.Ctime),
+		Mtime:     statxTimestampFromHost(stat.Mtime),
+	}, nil
+}
+
+func statxTimestampFromHost(ts unix.StatxTimestamp) linux.StatxTimestamp {
+	return linux.StatxTimestamp{
+		Sec:  ts.Sec,
+		Nsec: ts.Nsec,
+	}
+}
+
+// fstatToFromStat is a fallback for fstatTo if the host doesn't support
+// statx(2). fstat(2) doesn't provide the file creation time.
+func fstatToFromStat(hostFD int) (linux.Statx, error) {
 	var stat unix.Stat_t
 	if err := unix.Fstat(hostFD, &stat); err != nil {
 		return linux.Statx{}, err
 	}
-
 	return linux.Statx{
 		Mask:      unix.STATX_TYPE | unix.STATX_MODE | unix.STATX_INO | unix.STATX_NLINK | unix.STATX_UID | unix.STATX_GID | unix.STATX_SIZE | unix.STATX_BLOCKS | unix.STATX_ATIME | unix.STATX_MTIME | unix.STATX_CTIME,
 		Mode:      uint16(stat.Mode),
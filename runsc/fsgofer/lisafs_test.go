@@ -55,3 +55,7 @@ func (tester) SetUserGroupIDSupported() bool {
 func TestFSGofer(t *testing.T) {
 	testsuite.RunAllLocalFSTests(t, tester{})
 }
+
+func TestFSGoferReconnect(t *testing.T) {
+	testsuite.RunReconnectTest(t, tester{})
+}
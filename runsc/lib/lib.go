@@ -0,0 +1,340 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lib provides a Go API to create and manage sandboxed containers
+// from another program, without going through the runsc command line. The
+// runsc commands that manage the container lifecycle are implemented on top of
+// it.
+//
+// Sandbox and gofer processes are still started from the runsc binary, see
+// SetBinaryPath.
+package lib
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/sentry/state"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/sandbox"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// SetBinaryPath sets the path to the runsc binary that sandbox and gofer
+// processes are started from. It defaults to the running executable, which is
+// only correct for runsc itself. It must be called before any container is
+// created.
+func SetBinaryPath(path string) {
+	specutils.ExePath = path
+}
+
+// Args is used to configure a new container.
+type Args struct {
+	// ID is the container unique identifier.
+	ID string
+
+	// Spec is the OCI spec that describes the container. It's owned by the
+	// container once passed to New.
+	Spec *specs.Spec
+
+	// BundleDir is the directory containing the container bundle.
+	BundleDir string
+
+	// ConsoleSocket is the path to a unix domain socket that will receive
+	// the console FD. It may be empty.
+	ConsoleSocket string
+
+	// PIDFile is the filename where the container's root process PID will be
+	// written to. It may be empty.
+	PIDFile string
+
+	// UserLog is the filename to send user-visible logs to. It may be empty.
+	UserLog string
+
+	// Attached indicates that the sandbox lifecycle is attached with the
+	// calling process. If the caller exits, the sandbox exits too.
+	Attached bool
+
+	// NetNS, if not nil, is an open network namespace, e.g.
+	// /var/run/netns/<name>, that the sandbox joins in place of the network
+	// namespace in Spec. It's only used by New, and may be closed once New
+	// returns.
+	NetNS *os.File
+
+	// RootFS, if not nil, is an open directory that is used as the root
+	// filesystem of the container in place of Spec.Root.Path. The gofer
+	// mounts the directory by path, so it must remain reachable at the path
+	// it was opened from until the container is started.
+	RootFS *os.File
+}
+
+// Container is a handle to a container. Its methods are safe for concurrent
+// use, and handles to different containers can be used in parallel.
+// Operations that change the state of a container are serialized with the
+// lock on its state file, so they are also safe against runsc commands and
+// other handles to the same container.
+type Container struct {
+	// conf is the configuration used for all operations on the container. It
+	// must not be modified while methods of the container are running.
+	conf *config.Config
+
+	// mu protects c. Long-running waits don't hold mu, so that the container
+	// can be signaled or destroyed while they are in progress.
+	mu sync.Mutex
+	c  *container.Container
+}
+
+// New creates the container in a new sandbox, unless its spec indicates that
+// an existing sandbox should be used. The caller must call Destroy on the
+// container.
+func New(conf *config.Config, args Args) (*Container, error) {
+	if err := applyFiles(args.Spec, args.NetNS, args.RootFS); err != nil {
+		return nil, err
+	}
+	c, err := container.New(conf, container.Args{
+		ID:            args.ID,
+		Spec:          args.Spec,
+		BundleDir:     args.BundleDir,
+		ConsoleSocket: args.ConsoleSocket,
+		PIDFile:       args.PIDFile,
+		UserLog:       args.UserLog,
+		Attached:      args.Attached,
+	})
+	// The namespace is joined by path while the sandbox is created.
+	runtime.KeepAlive(args.NetNS)
+	if err != nil {
+		return nil, err
+	}
+	return &Container{conf: conf, c: c}, nil
+}
+
+// Load returns a handle to an existing container. id may be an abbreviation of
+// the container ID, as in runsc commands. Errors satisfying os.IsNotExist are
+// returned if the container doesn't exist.
+func Load(conf *config.Config, id string) (*Container, error) {
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		return nil, err
+	}
+	return &Container{conf: conf, c: c}, nil
+}
+
+// applyFiles makes spec refer to the given pre-opened network namespace and
+// root filesystem. Either may be nil.
+func applyFiles(spec *specs.Spec, netNS, rootFS *os.File) error {
+	if netNS != nil {
+		if spec.Linux == nil {
+			spec.Linux = &specs.Linux{}
+		}
+		ns := specs.LinuxNamespace{
+			Type: specs.NetworkNamespace,
+			// The sandbox joins the namespace from this process.
+			Path: fmt.Sprintf("/proc/self/fd/%d", netNS.Fd()),
+		}
+		found := false
+		for i := range spec.Linux.Namespaces {
+			if spec.Linux.Namespaces[i].Type == specs.NetworkNamespace {
+				spec.Linux.Namespaces[i] = ns
+				found = true
+			}
+		}
+		if !found {
+			spec.Linux.Namespaces = append(spec.Linux.Namespaces, ns)
+		}
+	}
+	if rootFS != nil {
+		fi, err := rootFS.Stat()
+		if err != nil {
+			return fmt.Errorf("stat root filesystem %q: %w", rootFS.Name(), err)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("root filesystem %q is not a directory", rootFS.Name())
+		}
+		path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", rootFS.Fd()))
+		if err != nil {
+			return fmt.Errorf("resolving root filesystem %q: %w", rootFS.Name(), err)
+		}
+		if spec.Root == nil {
+			spec.Root = &specs.Root{}
+		}
+		spec.Root.Path = path
+	}
+	return nil
+}
+
+// ID returns the container ID.
+func (c *Container) ID() string {
+	return c.c.ID
+}
+
+// BundleDir returns the directory containing the container bundle.
+func (c *Container) BundleDir() string {
+	return c.c.BundleDir
+}
+
+// Status returns the container status.
+func (c *Container) Status() container.Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Status
+}
+
+// State returns the OCI state of the container.
+func (c *Container) State() specs.State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.State()
+}
+
+// Start starts running the container's init process.
+func (c *Container) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Start(c.conf)
+}
+
+// Restore restores the container from a checkpoint image instead of starting
+// it. The image is read sequentially, so it may be a pipe or a socket.
+func (c *Container) Restore(image *os.File) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.RestoreFrom(c.c.Spec, c.conf, image)
+}
+
+// Execute runs a new process in the container and returns its PID in the
+// container's PID namespace.
+func (c *Container) Execute(args *control.ExecArgs) (int32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Execute(c.conf, args)
+}
+
+// sandbox returns the sandbox that the container runs in. Sandbox methods may
+// be called without holding c.mu.
+func (c *Container) sandbox() (*sandbox.Sandbox, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.c.Sandbox == nil {
+		return nil, fmt.Errorf("container %q has no sandbox", c.c.ID)
+	}
+	return c.c.Sandbox, nil
+}
+
+// Wait waits for the container's init process to exit and returns its
+// WaitStatus. If timeout is positive and the process hasn't exited within
+// timeout, an error wrapping boot.ErrWaitTimeout is returned.
+func (c *Container) Wait(timeout time.Duration) (unix.WaitStatus, error) {
+	sb, err := c.sandbox()
+	if err != nil {
+		return 0, err
+	}
+	ws, err := sb.Wait(c.c.ID, timeout)
+	if err == nil {
+		c.mu.Lock()
+		c.c.RefreshStatus()
+		c.mu.Unlock()
+	}
+	return ws, err
+}
+
+// WaitPID waits for process pid in the container's PID namespace to exit and
+// returns its WaitStatus. See Wait for timeout.
+func (c *Container) WaitPID(pid int32, timeout time.Duration) (unix.WaitStatus, error) {
+	sb, err := c.sandbox()
+	if err != nil {
+		return 0, err
+	}
+	if !sb.IsRunning() {
+		return 0, fmt.Errorf("sandbox is not running")
+	}
+	return sb.WaitPID(c.c.ID, pid, timeout)
+}
+
+// WaitRootPID is like WaitPID, but pid is in the PID namespace of the sandbox.
+func (c *Container) WaitRootPID(pid int32, timeout time.Duration) (unix.WaitStatus, error) {
+	sb, err := c.sandbox()
+	if err != nil {
+		return 0, err
+	}
+	if !sb.IsRunning() {
+		return 0, fmt.Errorf("sandbox is not running")
+	}
+	return sb.WaitPID(sb.ID, pid, timeout)
+}
+
+// Signal sends sig to the container's init process, or to all processes in
+// the container if all is true.
+func (c *Container) Signal(sig unix.Signal, all bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.SignalContainer(sig, all)
+}
+
+// Checkpoint writes a checkpoint image of the container to image. If pages
+// is not nil, the contents of memory are written to it instead, which allows
+// them to be loaded lazily on restore. If key is not nil, the image is
+// encrypted with it. If leaveRunning is false, the sandbox exits once the
+// image is written.
+func (c *Container) Checkpoint(image, pages *os.File, key []byte, leaveRunning bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Checkpoint(image, pages, key, leaveRunning)
+}
+
+// Migrate migrates the container's sandbox to the live migration destination
+// connected to by conn, and returns the durations of the phases of the
+// migration. The sandbox exits once it has been restored at the destination,
+// and keeps running if migration fails.
+func (c *Container) Migrate(conn *os.File, maxRounds int, dirtyThreshold uint64) (state.MigrationStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Migrate(conn, maxRounds, dirtyThreshold)
+}
+
+// Event returns the container's current statistics.
+func (c *Container) Event() (*boot.EventOut, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Event()
+}
+
+// Events passes the container's events to fn every interval, until the
+// container stops or fn returns an error. See container.StreamEvents.
+func (c *Container) Events(interval time.Duration, fn func(*boot.Event) error) error {
+	// Stream from a private copy of the container, which is reloaded from its
+	// state file, so that c.mu isn't held for the lifetime of the stream.
+	c.mu.Lock()
+	cp, err := container.Load(c.c.Saver.RootDir, c.c.Saver.ID, container.LoadOpts{Exact: true})
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return cp.StreamEvents(interval, fn)
+}
+
+// Destroy stops all processes and frees all resources associated with the
+// container. It's safe to call Destroy more than once.
+func (c *Container) Destroy() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Destroy()
+}
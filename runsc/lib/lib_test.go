@@ -0,0 +1,109 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestApplyFilesNetNS(t *testing.T) {
+	f, err := os.Open("/proc/self/ns/net")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	want := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+
+	for _, tc := range []struct {
+		name string
+		spec *specs.Spec
+	}{
+		{
+			name: "no linux",
+			spec: &specs.Spec{},
+		},
+		{
+			name: "new namespace",
+			spec: &specs.Spec{
+				Linux: &specs.Linux{
+					Namespaces: []specs.LinuxNamespace{
+						{Type: specs.PIDNamespace},
+						{Type: specs.NetworkNamespace},
+					},
+				},
+			},
+		},
+		{
+			name: "namespace path",
+			spec: &specs.Spec{
+				Linux: &specs.Linux{
+					Namespaces: []specs.LinuxNamespace{
+						{Type: specs.NetworkNamespace, Path: "/var/run/netns/foo"},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := applyFiles(tc.spec, f, nil); err != nil {
+				t.Fatalf("applyFiles: %v", err)
+			}
+			var got []string
+			for _, ns := range tc.spec.Linux.Namespaces {
+				if ns.Type == specs.NetworkNamespace {
+					got = append(got, ns.Path)
+				}
+			}
+			if len(got) != 1 || got[0] != want {
+				t.Errorf("network namespace paths: got %q, want [%q]", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyFilesRootFS(t *testing.T) {
+	dir := t.TempDir()
+	d, err := os.Open(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer d.Close()
+
+	spec := &specs.Spec{Root: &specs.Root{Path: "/some/other/root"}}
+	if err := applyFiles(spec, nil, d); err != nil {
+		t.Fatalf("applyFiles: %v", err)
+	}
+	if spec.Root.Path != dir {
+		t.Errorf("root path: got %q, want %q", spec.Root.Path, dir)
+	}
+
+	path := filepath.Join(dir, "file")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	if err := applyFiles(&specs.Spec{}, nil, f); err == nil {
+		t.Errorf("applyFiles with a regular file succeeded")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/cenkalti/backoff"
+)
+
+// ManifestName is the name of the object that an image's manifest is saved
+// to.
+const ManifestName = "manifest.json"
+
+// maxManifestSize is the largest manifest that is loaded.
+const maxManifestSize = 16 << 20
+
+// Manifest describes the files of a saved image.
+type Manifest struct {
+	// ChunkSize is the size of every chunk but the last of each file.
+	ChunkSize int64 `json:"chunkSize"`
+
+	// Files are the files of the image.
+	Files []File `json:"files"`
+}
+
+// File describes a single file of an image.
+type File struct {
+	// Name is the name of the file.
+	Name string `json:"name"`
+
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+
+	// Chunks are the hex encoded SHA-256 hashes of each chunk of the file.
+	Chunks []string `json:"chunks"`
+}
+
+// Lookup returns the file called name in m.
+func (m *Manifest) Lookup(name string) (*File, bool) {
+	for i := range m.Files {
+		if m.Files[i].Name == name {
+			return &m.Files[i], true
+		}
+	}
+	return nil, false
+}
+
+// validate checks that m is consistent, so that it can't be used to write
+// outside of the directory an image is downloaded to.
+func (m *Manifest) validate() error {
+	if m.ChunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %d", m.ChunkSize)
+	}
+	for _, f := range m.Files {
+		if f.Name == "" || f.Name == "." || f.Name == ".." || filepath.Base(f.Name) != f.Name {
+			return fmt.Errorf("invalid file name %q", f.Name)
+		}
+		if f.Size < 0 {
+			return fmt.Errorf("%s: invalid size %d", f.Name, f.Size)
+		}
+		if want := (f.Size + m.ChunkSize - 1) / m.ChunkSize; int64(len(f.Chunks)) != want {
+			return fmt.Errorf("%s: got %d chunks, want %d", f.Name, len(f.Chunks), want)
+		}
+	}
+	return nil
+}
+
+// chunkName returns the name of the object that chunk idx of the file name is
+// saved to.
+func chunkName(name string, idx int64) string {
+	return fmt.Sprintf("%s.%05d", name, idx)
+}
+
+// PutManifest saves m to s. It must be called after all of the files that m
+// describes have been uploaded, so that the image can't be restored while
+// it is incomplete.
+func (s *Store) PutManifest(ctx context.Context, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.put(ctx, ManifestName, data)
+}
+
+// GetManifest loads and validates the manifest of the image in s.
+func (s *Store) GetManifest(ctx context.Context) (*Manifest, error) {
+	var data []byte
+	err := s.retry(ctx, "downloading "+ManifestName, func() error {
+		resp, err := s.send(ctx, http.MethodGet, ManifestName, nil, nil, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+		if err != nil {
+			return err
+		}
+		if len(data) > maxManifestSize {
+			return backoff.Permanent(fmt.Errorf("%s is larger than %d bytes", ManifestName, maxManifestSize))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", ManifestName, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ManifestName, err)
+	}
+	return &m, nil
+}
+
+// UploadDir uploads the files called names in the local directory dir to s,
+// followed by a manifest describing them. Files in names that don't exist are
+// skipped.
+func (s *Store) UploadDir(ctx context.Context, dir string, names []string) error {
+	m := Manifest{ChunkSize: s.ChunkSize}
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		file, err := s.Upload(ctx, name, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("uploading %s: %v", name, err)
+		}
+		m.Files = append(m.Files, file)
+	}
+	return s.PutManifest(ctx, &m)
+}
+
+// DownloadDir downloads every file of the image in s to the local directory
+// dir, after checking the hash of each chunk against the image's manifest.
+func (s *Store) DownloadDir(ctx context.Context, dir string) error {
+	m, err := s.GetManifest(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range m.Files {
+		file := &m.Files[i]
+		path := filepath.Join(dir, file.Name)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		err = s.Download(ctx, m, file, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("downloading %s: %v", file.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote saves checkpoint images to, and loads them from, an HTTP
+// object store.
+//
+// An image is addressed by a base URL, e.g.
+// https://bucket.s3.amazonaws.com/checkpoints/foo. Each file of the image is
+// split into fixed size chunks, which are uploaded in parallel as separate
+// objects named <base>/<file>.<index>, and a manifest of the SHA-256 hash of
+// every chunk is written to <base>/manifest.json once all of them have been
+// saved. Any query string of the base URL, e.g. a signature or access token
+// scoped to the prefix, is sent with every request.
+//
+// Requests that fail with transient errors are retried with exponential
+// backoff, and downloads that fail part way are resumed with range requests.
+// Proxies are configured by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+const (
+	// DefaultChunkSize is the default size of the chunks that files are
+	// split into.
+	DefaultChunkSize = 64 << 20
+
+	// DefaultParallelism is the default number of chunks that are
+	// transferred at once.
+	DefaultParallelism = 8
+
+	// maxElapsedTime is how long requests for a single object are retried
+	// for.
+	maxElapsedTime = 5 * time.Minute
+)
+
+// IsURL returns true if path names a remote image rather than a local
+// directory.
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// Store is a checkpoint image in an HTTP object store.
+type Store struct {
+	base   *url.URL
+	client *http.Client
+
+	// ChunkSize is the size of the chunks that files are split into when
+	// they are uploaded.
+	ChunkSize int64
+
+	// Parallelism is the maximum number of chunks that are transferred at
+	// once.
+	Parallelism int
+
+	// Resume skips uploading chunks that s already holds identical copies
+	// of, e.g. because a previous upload of the same image failed part way.
+	Resume bool
+
+	// newBackOff returns the policy that failed requests are retried with.
+	newBackOff func() backoff.BackOff
+}
+
+// NewStore returns a Store for the image at rawURL.
+func NewStore(rawURL string) (*Store, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image URL: %v", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported image URL scheme %q", base.Scheme)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	return &Store{
+		base:        base,
+		client:      &http.Client{Transport: transport},
+		ChunkSize:   DefaultChunkSize,
+		Parallelism: DefaultParallelism,
+		newBackOff: func() backoff.BackOff {
+			b := backoff.NewExponentialBackOff()
+			b.MaxElapsedTime = maxElapsedTime
+			return b
+		},
+	}, nil
+}
+
+// objectURL returns the URL of the object name in s.
+func (s *Store) objectURL(name string) string {
+	u := *s.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+	u.RawPath = ""
+	return u.String()
+}
+
+// statusError is returned for responses with unexpected status codes.
+type statusError struct {
+	method string
+	name   string
+	code   int
+}
+
+// Error implements error.Error.
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.method, e.name, e.code, http.StatusText(e.code))
+}
+
+// transient returns true if requests that failed with the given status code
+// may succeed if retried.
+func transient(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// retry calls op until it succeeds, returns a permanent error, or s's backoff
+// policy gives up.
+func (s *Store) retry(ctx context.Context, what string, op func() error) error {
+	b := backoff.WithContext(s.newBackOff(), ctx)
+	return backoff.RetryNotify(op, b, func(err error, d time.Duration) {
+		log.Warningf("%s failed, retrying in %v: %v", what, d, err)
+	})
+}
+
+// send sends a single request for the object name, and returns the response
+// if its status is one of want. Errors that mustn't be retried are wrapped in
+// *backoff.PermanentError.
+func (s *Store) send(ctx context.Context, method, name string, header http.Header, body []byte, want ...int) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(name), r)
+	if err != nil {
+		return nil, backoff.Permanent(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Don't log any credentials in the query string.
+		if uerr, ok := err.(*url.Error); ok {
+			uerr.URL = name
+		}
+		if ctx.Err() != nil {
+			return nil, backoff.Permanent(err)
+		}
+		return nil, err
+	}
+	for _, code := range want {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	err = &statusError{method: method, name: name, code: resp.StatusCode}
+	if !transient(resp.StatusCode) {
+		return nil, backoff.Permanent(err)
+	}
+	return nil, err
+}
+
+// put uploads data to the object name.
+func (s *Store) put(ctx context.Context, name string, data []byte) error {
+	return s.retry(ctx, "uploading "+name, func() error {
+		resp, err := s.send(ctx, http.MethodPut, name, nil, data, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+}
+
+// head returns the size and entity tag of the object name, or ok == false
+// if it doesn't exist.
+func (s *Store) head(ctx context.Context, name string) (size int64, etag string, ok bool, err error) {
+	err = s.retry(ctx, "checking "+name, func() error {
+		resp, err := s.send(ctx, http.MethodHead, name, nil, nil, http.StatusOK, http.StatusNotFound, http.StatusForbidden)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		// Stores that sign URLs per method, e.g. S3, refuse HEAD requests
+		// signed for PUT; treat them like missing objects.
+		ok = resp.StatusCode == http.StatusOK
+		size = resp.ContentLength
+		etag = resp.Header.Get("ETag")
+		return nil
+	})
+	return size, etag, ok, err
+}
+
+// get downloads the object name, which must be len(buf) bytes, into buf. If the
+// download fails part way, it is resumed from where it stopped.
+func (s *Store) get(ctx context.Context, name string, buf []byte) error {
+	n := 0
+	return s.retry(ctx, "downloading "+name, func() error {
+		var header http.Header
+		if n > 0 {
+			header = http.Header{"Range": {fmt.Sprintf("bytes=%d-", n)}}
+		}
+		resp, err := s.send(ctx, http.MethodGet, name, header, nil, http.StatusOK, http.StatusPartialContent)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			// The store ignored the range; start again.
+			n = 0
+		}
+		m, err := io.ReadFull(resp.Body, buf[n:])
+		n += m
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			// The connection was cut short, or the object is shorter than
+			// the manifest says.
+			if resp.ContentLength >= 0 && int64(m) == resp.ContentLength {
+				return backoff.Permanent(fmt.Errorf("%s is %d bytes, want %d", name, n, len(buf)))
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if extra, _ := resp.Body.Read(make([]byte, 1)); extra > 0 {
+			return backoff.Permanent(fmt.Errorf("%s is longer than %d bytes", name, len(buf)))
+		}
+		return nil
+	})
+}
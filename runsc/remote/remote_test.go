@@ -0,0 +1,348 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cenkalti/backoff"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// objectServer is a minimal HTTP object store.
+type objectServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    map[string]int
+
+	// failPuts is the number of times each object's first uploads fail.
+	failPuts int
+
+	// cutGets is the number of times each object's first downloads are cut
+	// short half way.
+	cutGets int
+	gets    map[string]int
+}
+
+func newObjectServer() *objectServer {
+	return &objectServer{
+		objects: make(map[string][]byte),
+		puts:    make(map[string]int),
+		gets:    make(map[string]int),
+	}
+}
+
+func (o *objectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("token") != "secret" {
+		http.Error(w, "bad token", http.StatusForbidden)
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	name := r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		o.puts[name]++
+		if o.puts[name] <= o.failPuts {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		o.objects[name] = data
+		sum := md5.Sum(data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case http.MethodHead, http.MethodGet:
+		data, ok := o.objects[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		sum := md5.Sum(data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+			return
+		}
+		status := http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start int
+			if _, err := fmt.Sscanf(rng, "bytes=%d-", &start); err != nil || start > len(data) {
+				http.Error(w, "bad range", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+			data = data[start:]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.WriteHeader(status)
+		o.gets[name]++
+		if o.gets[name] <= o.cutGets {
+			// Send half of the object, then drop the connection.
+			w.Write(data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(data)
+	default:
+		http.Error(w, "bad method", http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestStore(t *testing.T, o *objectServer) *Store {
+	t.Helper()
+	srv := httptest.NewServer(o)
+	t.Cleanup(srv.Close)
+	s, err := NewStore(srv.URL + "/images/foo?token=secret")
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	s.ChunkSize = 1000
+	s.Parallelism = 3
+	s.newBackOff = func() backoff.BackOff {
+		return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 5)
+	}
+	return s
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{
+		{path: "/var/lib/checkpoint", want: false},
+		{path: "relative/http://x", want: false},
+		{path: "http://example.com/foo", want: true},
+		{path: "https://bucket.s3.amazonaws.com/foo?X-Amz-Signature=x", want: true},
+	} {
+		if got := IsURL(tc.path); got != tc.want {
+			t.Errorf("IsURL(%q) = %t, want %t", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	o := newObjectServer()
+	o.failPuts = 2
+	o.cutGets = 1
+	s := newTestStore(t, o)
+
+	files := map[string][]byte{
+		"checkpoint.img": testData(2500),
+		"pages.img":      testData(10000),
+		"empty":          nil,
+	}
+	src := t.TempDir()
+	writeFiles(t, src, files)
+	ctx := context.Background()
+	if err := s.UploadDir(ctx, src, []string{"checkpoint.img", "pages.img", "empty", "missing"}); err != nil {
+		t.Fatalf("UploadDir: %v", err)
+	}
+	if _, ok := o.objects["/images/foo/pages.img.00009"]; !ok {
+		t.Errorf("last chunk of pages.img not uploaded")
+	}
+	if _, ok := o.objects["/images/foo/missing.00000"]; ok {
+		t.Errorf("missing file uploaded")
+	}
+
+	dst := t.TempDir()
+	if err := s.DownloadDir(ctx, dst); err != nil {
+		t.Fatalf("DownloadDir: %v", err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %d bytes, want %d bytes", name, len(got), len(want))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "missing")); !os.IsNotExist(err) {
+		t.Errorf("missing file downloaded: %v", err)
+	}
+}
+
+func TestReaderAt(t *testing.T) {
+	o := newObjectServer()
+	s := newTestStore(t, o)
+	data := testData(3500)
+	ctx := context.Background()
+	file, err := s.Upload(ctx, "pages.img", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	m := &Manifest{ChunkSize: s.ChunkSize, Files: []File{file}}
+	r := s.NewReader(ctx, m, &m.Files[0])
+	for _, tc := range []struct {
+		off, len int
+	}{
+		{off: 0, len: 1000},
+		{off: 900, len: 200},
+		{off: 1500, len: 2000},
+		{off: 3400, len: 100},
+	} {
+		p := make([]byte, tc.len)
+		if n, err := r.ReadAt(p, int64(tc.off)); err != nil || n != tc.len {
+			t.Errorf("ReadAt(%d, %d) = %d, %v", tc.off, tc.len, n, err)
+		} else if !bytes.Equal(p, data[tc.off:tc.off+tc.len]) {
+			t.Errorf("ReadAt(%d, %d) returned wrong data", tc.off, tc.len)
+		}
+	}
+	p := make([]byte, 200)
+	if n, err := r.ReadAt(p, 3400); err != io.EOF || n != 100 {
+		t.Errorf("ReadAt past end = %d, %v, want 100, EOF", n, err)
+	}
+}
+
+func TestWriterOutOfOrder(t *testing.T) {
+	o := newObjectServer()
+	s := newTestStore(t, o)
+	data := testData(2600)
+	w := s.NewWriter(context.Background(), "pages.img")
+	for _, off := range []int{2000, 500, 0, 1500, 1000} {
+		end := off + 500
+		if off == 2000 {
+			end = len(data)
+		}
+		if _, err := w.WriteAt(data[off:end], int64(off)); err != nil {
+			t.Fatalf("WriteAt(%d): %v", off, err)
+		}
+	}
+	file, err := w.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if file.Size != int64(len(data)) || len(file.Chunks) != 3 {
+		t.Errorf("got size %d with %d chunks, want %d with 3", file.Size, len(file.Chunks), len(data))
+	}
+	if got := o.objects["/images/foo/pages.img.00002"]; !bytes.Equal(got, data[2000:]) {
+		t.Errorf("last chunk has wrong contents")
+	}
+}
+
+func TestWriterHole(t *testing.T) {
+	o := newObjectServer()
+	s := newTestStore(t, o)
+	w := s.NewWriter(context.Background(), "pages.img")
+	if _, err := w.WriteAt(testData(100), 1500); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if _, err := w.Close(); err == nil {
+		t.Errorf("Close succeeded with unwritten chunks")
+	}
+}
+
+func TestResume(t *testing.T) {
+	o := newObjectServer()
+	s := newTestStore(t, o)
+	src := t.TempDir()
+	writeFiles(t, src, map[string][]byte{"pages.img": testData(5000)})
+	ctx := context.Background()
+	if err := s.UploadDir(ctx, src, []string{"pages.img"}); err != nil {
+		t.Fatalf("UploadDir: %v", err)
+	}
+	// Corrupt one chunk, as if a previous upload had failed before saving
+	// it.
+	o.objects["/images/foo/pages.img.00003"] = []byte("partial")
+
+	s.Resume = true
+	if err := s.UploadDir(ctx, src, []string{"pages.img"}); err != nil {
+		t.Fatalf("UploadDir: %v", err)
+	}
+	for idx := 0; idx < 5; idx++ {
+		name := fmt.Sprintf("/images/foo/pages.img.%05d", idx)
+		want := 1
+		if idx == 3 {
+			want = 2
+		}
+		if got := o.puts[name]; got != want {
+			t.Errorf("%s uploaded %d times, want %d", name, got, want)
+		}
+	}
+}
+
+func TestCorruptChunk(t *testing.T) {
+	o := newObjectServer()
+	s := newTestStore(t, o)
+	src := t.TempDir()
+	writeFiles(t, src, map[string][]byte{"checkpoint.img": testData(3000)})
+	ctx := context.Background()
+	if err := s.UploadDir(ctx, src, []string{"checkpoint.img"}); err != nil {
+		t.Fatalf("UploadDir: %v", err)
+	}
+	o.objects["/images/foo/checkpoint.img.00001"][10] ^= 1
+
+	err := s.DownloadDir(ctx, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "hash") {
+		t.Errorf("DownloadDir got error %v, want hash mismatch", err)
+	}
+}
+
+func TestInvalidManifest(t *testing.T) {
+	for _, m := range []string{
+		`{"chunkSize": 0, "files": []}`,
+		`{"chunkSize": 10, "files": [{"name": "../x", "size": 0}]}`,
+		`{"chunkSize": 10, "files": [{"name": "x", "size": 11, "chunks": ["a"]}]}`,
+	} {
+		o := newObjectServer()
+		s := newTestStore(t, o)
+		o.objects["/images/foo/"+ManifestName] = []byte(m)
+		if _, err := s.GetManifest(context.Background()); err == nil {
+			t.Errorf("GetManifest(%s) succeeded", m)
+		}
+	}
+}
+
+func TestPermanentError(t *testing.T) {
+	o := newObjectServer()
+	s := newTestStore(t, o)
+	s.base.RawQuery = "token=wrong"
+	if err := s.put(context.Background(), "x", []byte("x")); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("put got error %v, want 403", err)
+	}
+}
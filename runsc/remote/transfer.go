@@ -0,0 +1,353 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Writer is an io.WriterAt that uploads a file to a Store. Each chunk of the
+// file is uploaded as soon as it has been written in full, in parallel with
+// writes to the rest of the file.
+//
+// Writes may be made in any order, but mustn't overlap.
+type Writer struct {
+	s    *Store
+	ctx  context.Context
+	name string
+
+	// sem limits the number of chunks that are uploaded at once.
+	sem chan struct{}
+
+	// wg counts chunks that are being uploaded.
+	wg sync.WaitGroup
+
+	mu sync.Mutex
+
+	// pending are the chunks that haven't been written in full yet, by
+	// index.
+	pending map[int64]*pendingChunk
+
+	// hashes are the hashes of the chunks that have been uploaded, by index.
+	hashes map[int64]string
+
+	// size is the offset of the end of the furthest write.
+	size int64
+
+	// err is the first error that an upload failed with.
+	err error
+}
+
+// pendingChunk is a chunk that is being written.
+type pendingChunk struct {
+	data []byte
+
+	// written is the number of bytes of data that have been written.
+	written int64
+}
+
+// NewWriter returns a Writer that uploads the file name to s.
+func (s *Store) NewWriter(ctx context.Context, name string) *Writer {
+	return &Writer{
+		s:       s,
+		ctx:     ctx,
+		name:    name,
+		sem:     make(chan struct{}, s.Parallelism),
+		pending: make(map[int64]*pendingChunk),
+		hashes:  make(map[int64]string),
+	}
+}
+
+// WriteAt implements io.WriterAt.WriteAt.
+func (w *Writer) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	size := w.s.ChunkSize
+	n := 0
+	for n < len(p) {
+		idx := off / size
+		c, ok := w.pending[idx]
+		if !ok {
+			if _, ok := w.hashes[idx]; ok {
+				return n, fmt.Errorf("chunk %d of %s was already written", idx, w.name)
+			}
+			c = &pendingChunk{data: make([]byte, size)}
+			w.pending[idx] = c
+		}
+		m := copy(c.data[off%size:], p[n:])
+		c.written += int64(m)
+		n += m
+		off += int64(m)
+		if off > w.size {
+			w.size = off
+		}
+		if c.written == size {
+			delete(w.pending, idx)
+			w.uploadLocked(idx, c.data)
+		}
+	}
+	return n, nil
+}
+
+// uploadLocked starts uploading chunk idx, once fewer than s.Parallelism
+// other chunks are being uploaded.
+//
+// Preconditions: w.mu is locked.
+func (w *Writer) uploadLocked(idx int64, data []byte) {
+	w.sem <- struct{}{}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		hash, err := w.uploadChunk(idx, data)
+		<-w.sem
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if err != nil {
+			if w.err == nil {
+				w.err = err
+			}
+			return
+		}
+		w.hashes[idx] = hash
+	}()
+}
+
+// uploadChunk uploads data as chunk idx, and returns its hash. If s.Resume is
+// set and the store already holds an identical copy of the chunk, it isn't
+// uploaded again.
+func (w *Writer) uploadChunk(idx int64, data []byte) (string, error) {
+	sha := sha256.Sum256(data)
+	hash := hex.EncodeToString(sha[:])
+	name := chunkName(w.name, idx)
+	if w.s.Resume {
+		// Stores such as S3 use the MD5 hash of objects that were
+		// uploaded in a single request as their entity tag.
+		sum := md5.Sum(data)
+		size, etag, ok, err := w.s.head(w.ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if ok && size == int64(len(data)) && etag == `"`+hex.EncodeToString(sum[:])+`"` {
+			return hash, nil
+		}
+	}
+	if err := w.s.put(w.ctx, name, data); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Close uploads the last chunk of the file, waits for all uploads to complete,
+// and returns a description of the file for the image's manifest.
+func (w *Writer) Close() (File, error) {
+	w.mu.Lock()
+	size := w.s.ChunkSize
+	last := int64(-1)
+	if w.size > 0 {
+		last = (w.size - 1) / size
+	}
+	for idx, c := range w.pending {
+		if idx != last || c.written != w.size-idx*size {
+			w.mu.Unlock()
+			w.wg.Wait()
+			return File{}, fmt.Errorf("chunk %d of %s was only partially written", idx, w.name)
+		}
+		delete(w.pending, idx)
+		w.uploadLocked(idx, c.data[:c.written])
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return File{}, w.err
+	}
+	file := File{Name: w.name, Size: w.size}
+	for idx := int64(0); idx <= last; idx++ {
+		hash, ok := w.hashes[idx]
+		if !ok {
+			return File{}, fmt.Errorf("chunk %d of %s was never written", idx, w.name)
+		}
+		file.Chunks = append(file.Chunks, hash)
+	}
+	return file, nil
+}
+
+// Upload uploads the contents of f to the file name in s.
+func (s *Store) Upload(ctx context.Context, name string, f io.ReaderAt) (File, error) {
+	w := s.NewWriter(ctx, name)
+	buf := make([]byte, s.ChunkSize)
+	for off := int64(0); ; off += s.ChunkSize {
+		n, err := f.ReadAt(buf, off)
+		if n > 0 {
+			if _, werr := w.WriteAt(buf[:n], off); werr != nil {
+				w.Close()
+				return File{}, werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.Close()
+			return File{}, err
+		}
+	}
+	return w.Close()
+}
+
+// Reader is an io.ReaderAt that reads a file from a Store. Each chunk of the
+// file is checked against the hash in the image's manifest before any of it
+// is returned.
+type Reader struct {
+	s         *Store
+	ctx       context.Context
+	file      *File
+	chunkSize int64
+}
+
+// NewReader returns a Reader for file, which is described by m.
+func (s *Store) NewReader(ctx context.Context, m *Manifest, file *File) *Reader {
+	return &Reader{
+		s:         s,
+		ctx:       ctx,
+		file:      file,
+		chunkSize: m.ChunkSize,
+	}
+}
+
+// Size returns the size of the file.
+func (r *Reader) Size() int64 {
+	return r.file.Size
+}
+
+// ReadAt implements io.ReaderAt.ReadAt. Reads of whole chunks are made
+// directly into p.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	n := 0
+	var buf []byte
+	for n < len(p) && off < r.file.Size {
+		idx := off / r.chunkSize
+		start := idx * r.chunkSize
+		end := start + r.chunkSize
+		if end > r.file.Size {
+			end = r.file.Size
+		}
+		chunk := end - start
+		var data []byte
+		if off == start && int64(len(p)-n) >= chunk {
+			data = p[n : n+int(chunk)]
+		} else {
+			if buf == nil {
+				buf = make([]byte, r.chunkSize)
+			}
+			data = buf[:chunk]
+		}
+		if err := r.readChunk(idx, data); err != nil {
+			return n, err
+		}
+		m := copy(p[n:], data[off-start:])
+		n += m
+		off += int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readChunk downloads chunk idx into data, and checks its hash.
+func (r *Reader) readChunk(idx int64, data []byte) error {
+	name := chunkName(r.file.Name, idx)
+	if err := r.s.get(r.ctx, name, data); err != nil {
+		return err
+	}
+	sha := sha256.Sum256(data)
+	if hex.EncodeToString(sha[:]) != r.file.Chunks[idx] {
+		return fmt.Errorf("%s doesn't match the hash in %s", name, ManifestName)
+	}
+	return nil
+}
+
+// Download downloads file, which is described by m, to dst. Chunks are
+// downloaded in parallel.
+func (s *Store) Download(ctx context.Context, m *Manifest, file *File, dst *os.File) error {
+	r := s.NewReader(ctx, m, file)
+	chunks := int64(len(file.Chunks))
+	idxs := make(chan int64)
+	errs := make(chan error, s.Parallelism)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.ctx = ctx
+	var wg sync.WaitGroup
+	for i := 0; i < s.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, m.ChunkSize)
+			for idx := range idxs {
+				off := idx * m.ChunkSize
+				n, err := r.ReadAt(buf, off)
+				if err == io.EOF && idx == chunks-1 {
+					err = nil
+				}
+				if err == nil {
+					_, err = dst.WriteAt(buf[:n], off)
+				}
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+loop:
+	for idx := int64(0); idx < chunks; idx++ {
+		select {
+		case idxs <- idx:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(idxs)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return dst.Truncate(file.Size)
+}
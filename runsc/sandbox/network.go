@@ -22,15 +22,20 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/shaper"
+	"gvisor.dev/gvisor/pkg/tcpip/link/tun"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/boot"
@@ -54,20 +59,36 @@ import (
 // Run the following container to test it:
 //
 //	docker run -di --runtime=runsc -p 8080:80 -v $PWD:/usr/local/apache2/htdocs/ httpd:2.4
-func setupNetwork(conn *urpc.Client, pid int, conf *config.Config) error {
+func setupNetwork(conn *urpc.Client, pid int, spec *specs.Spec, conf *config.Config) error {
 	log.Infof("Setting up network")
 
+	dummies, err := dummyLinks(spec)
+	if err != nil {
+		return err
+	}
+	if len(dummies) > 0 && conf.Network == config.NetworkHost {
+		return fmt.Errorf("dummy interfaces can't be created with host networking")
+	}
+	bandwidth, err := boot.BandwidthLimits(spec)
+	if err != nil {
+		return err
+	}
+	fdbasedLinks := (conf.Network == config.NetworkSandbox || conf.Network == config.NetworkDHCP) && !conf.AFXDP
+	if bandwidth != (shaper.Limits{}) && !fdbasedLinks {
+		log.Warningf("Bandwidth limits are only enforced for fd-based interfaces with sandbox networking, ignoring them")
+	}
+
 	switch conf.Network {
 	case config.NetworkNone:
 		log.Infof("Network is disabled, create loopback interface only")
-		if err := createDefaultLoopbackInterface(conn); err != nil {
+		if err := createDefaultLoopbackInterface(conn, dummies); err != nil {
 			return fmt.Errorf("creating default loopback interface: %v", err)
 		}
-	case config.NetworkSandbox:
+	case config.NetworkSandbox, config.NetworkDHCP:
 		// Build the path to the net namespace of the sandbox process.
 		// This is what we will copy.
 		nsPath := filepath.Join("/proc", strconv.Itoa(pid), "ns/net")
-		if err := createInterfacesAndRoutesFromNS(conn, nsPath, conf); err != nil {
+		if err := createInterfacesAndRoutesFromNS(conn, nsPath, dummies, bandwidth, conf); err != nil {
 			return fmt.Errorf("creating interfaces from net namespace %q: %v", nsPath, err)
 		}
 	case config.NetworkHost:
@@ -78,9 +99,10 @@ func setupNetwork(conn *urpc.Client, pid int, conf *config.Config) error {
 	return nil
 }
 
-func createDefaultLoopbackInterface(conn *urpc.Client) error {
+func createDefaultLoopbackInterface(conn *urpc.Client, dummies []boot.DummyLink) error {
 	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, &boot.CreateLinksAndRoutesArgs{
 		LoopbackLinks: []boot.LoopbackLink{boot.DefaultLoopbackLink},
+		DummyLinks:    dummies,
 	}, nil); err != nil {
 		return fmt.Errorf("creating loopback link and routes: %v", err)
 	}
@@ -119,8 +141,9 @@ func isRootNS() (bool, error) {
 
 // createInterfacesAndRoutesFromNS scrapes the interface and routes from the
 // net namespace with the given path, creates them in the sandbox, and removes
-// them from the host.
-func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *config.Config) error {
+// them from the host. With --network=dhcp, only the interfaces are created, and
+// their addresses and routes are leased with DHCP inside the sandbox instead.
+func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, dummies []boot.DummyLink, bandwidth shaper.Limits, conf *config.Config) error {
 	// Join the network namespace that we will be copying.
 	restore, err := joinNetNS(nsPath)
 	if err != nil {
@@ -143,7 +166,13 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 	}
 
 	// Collect addresses and routes from the interfaces.
-	var args boot.CreateLinksAndRoutesArgs
+	args := boot.CreateLinksAndRoutesArgs{
+		DummyLinks: dummies,
+	}
+	dhcp := conf.Network == config.NetworkDHCP
+	if dhcp {
+		args.DHCPTimeout = conf.DHCPTimeout
+	}
 	for _, iface := range ifaces {
 		if iface.Flags&net.FlagUp == 0 {
 			log.Infof("Skipping down interface: %+v", iface)
@@ -173,48 +202,41 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 			}
 			ipAddrs = append(ipAddrs, ipNet)
 		}
-		if len(ipAddrs) == 0 {
+		if len(ipAddrs) == 0 && !dhcp {
 			log.Warningf("No usable IP addresses found for interface %q, skipping", iface.Name)
 			continue
 		}
 
-		// Collect data from the ARP table.
-		dump, err := netlink.NeighList(iface.Index, 0)
+		neighbors, err := staticNeighbors(iface)
 		if err != nil {
-			return fmt.Errorf("fetching ARP table for %q: %w", iface.Name, err)
+			return err
 		}
 
-		var neighbors []boot.Neighbor
-		for _, n := range dump {
-			// There are only two "good" states NUD_PERMANENT and NUD_REACHABLE,
-			// but NUD_REACHABLE is fully dynamic and will be re-probed anyway.
-			if n.State == netlink.NUD_PERMANENT {
-				log.Debugf("Copying a static ARP entry: %+v %+v", n.IP, n.HardwareAddr)
-				// No flags are copied because Stack.AddStaticNeighbor does not support flags right now.
-				neighbors = append(neighbors, boot.Neighbor{IP: n.IP, HardwareAddr: n.HardwareAddr})
+		// With DHCP, routes are set up for leased addresses instead.
+		var routes []boot.Route
+		if !dhcp {
+			var defv4, defv6 *boot.Route
+			// Scrape the routes before removing the address, since that
+			// will remove the routes as well.
+			routes, defv4, defv6, err = routesForIface(iface)
+			if err != nil {
+				return fmt.Errorf("getting routes for interface %q: %v", iface.Name, err)
 			}
-		}
-
-		// Scrape the routes before removing the address, since that
-		// will remove the routes as well.
-		routes, defv4, defv6, err := routesForIface(iface)
-		if err != nil {
-			return fmt.Errorf("getting routes for interface %q: %v", iface.Name, err)
-		}
-		if defv4 != nil {
-			if !args.Defaultv4Gateway.Route.Empty() {
-				return fmt.Errorf("more than one default route found, interface: %v, route: %v, default route: %+v", iface.Name, defv4, args.Defaultv4Gateway)
+			if defv4 != nil {
+				if !args.Defaultv4Gateway.Route.Empty() {
+					return fmt.Errorf("more than one default route found, interface: %v, route: %v, default route: %+v", iface.Name, defv4, args.Defaultv4Gateway)
+				}
+				args.Defaultv4Gateway.Route = *defv4
+				args.Defaultv4Gateway.Name = iface.Name
 			}
-			args.Defaultv4Gateway.Route = *defv4
-			args.Defaultv4Gateway.Name = iface.Name
-		}
 
-		if defv6 != nil {
-			if !args.Defaultv6Gateway.Route.Empty() {
-				return fmt.Errorf("more than one default route found, interface: %v, route: %v, default route: %+v", iface.Name, defv6, args.Defaultv6Gateway)
+			if defv6 != nil {
+				if !args.Defaultv6Gateway.Route.Empty() {
+					return fmt.Errorf("more than one default route found, interface: %v, route: %v, default route: %+v", iface.Name, defv6, args.Defaultv6Gateway)
+				}
+				args.Defaultv6Gateway.Route = *defv6
+				args.Defaultv6Gateway.Name = iface.Name
 			}
-			args.Defaultv6Gateway.Route = *defv6
-			args.Defaultv6Gateway.Name = iface.Name
 		}
 
 		// Get the link for the interface.
@@ -226,22 +248,14 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 
 		// Collect the addresses for the interface, enable forwarding,
 		// and remove them from the host.
-		var addresses []boot.IPWithPrefix
-		for _, addr := range ipAddrs {
-			prefix, _ := addr.Mask.Size()
-			addresses = append(addresses, boot.IPWithPrefix{Address: addr.IP, PrefixLen: prefix})
-
-			// Steal IP address from NIC.
-			if err := removeAddress(ifaceLink, addr.String()); err != nil {
-				// If we encounter an error while deleting the ip,
-				// verify the ip is still present on the interface.
-				if present, err := isAddressOnInterface(iface.Name, addr); err != nil {
-					return fmt.Errorf("checking if address %v is on interface %q: %w", addr, iface.Name, err)
-				} else if !present {
-					continue
-				}
-				return fmt.Errorf("removing address %v from device %q: %w", addr, iface.Name, err)
-			}
+		addresses, err := stealAddresses(iface, ifaceLink, ipAddrs)
+		if err != nil {
+			return err
+		}
+		if dhcp {
+			// The host's addresses are removed all the same, so that the
+			// host doesn't answer for them, but the sandbox leases its own.
+			addresses = nil
 		}
 
 		if conf.AFXDP {
@@ -274,33 +288,15 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 				Neighbors:         neighbors,
 				LinkAddress:       linkAddress,
 				Addresses:         addresses,
+				DHCP:              dhcp,
+				Bandwidth:         bandwidth,
 			}
 
-			log.Debugf("Setting up network channels")
-			// Create the socket for the device.
-			for i := 0; i < link.NumChannels; i++ {
-				log.Debugf("Creating Channel %d", i)
-				socketEntry, err := createSocket(iface, ifaceLink, conf.HostGSO)
-				if err != nil {
-					return fmt.Errorf("failed to createSocket for %s : %w", iface.Name, err)
-				}
-				if i == 0 {
-					link.GSOMaxSize = socketEntry.gsoMaxSize
-				} else {
-					if link.GSOMaxSize != socketEntry.gsoMaxSize {
-						return fmt.Errorf("inconsistent gsoMaxSize %d and %d when creating multiple channels for same interface: %s",
-							link.GSOMaxSize, socketEntry.gsoMaxSize, iface.Name)
-					}
-				}
-				args.FilePayload.Files = append(args.FilePayload.Files, socketEntry.deviceFile)
-			}
-
-			if link.GSOMaxSize == 0 && conf.GvisorGSO {
-				// Host GSO is disabled. Let's enable gVisor GSO.
-				link.GSOMaxSize = stack.GvisorGSOMaxSize
-				link.GvisorGSOEnabled = true
+			files, err := createChannels(iface, ifaceLink, &link, conf)
+			if err != nil {
+				return err
 			}
-
+			args.FilePayload.Files = append(args.FilePayload.Files, files...)
 			args.FDBasedLinks = append(args.FDBasedLinks, link)
 		}
 	}
@@ -322,6 +318,200 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 	return nil
 }
 
+// staticNeighbors returns the permanent entries of the ARP table of iface.
+func staticNeighbors(iface net.Interface) ([]boot.Neighbor, error) {
+	// Collect data from the ARP table.
+	dump, err := netlink.NeighList(iface.Index, 0)
+	if err != nil {
+		return nil, fmt.Errorf("fetching ARP table for %q: %w", iface.Name, err)
+	}
+
+	var neighbors []boot.Neighbor
+	for _, n := range dump {
+		// There are only two "good" states NUD_PERMANENT and NUD_REACHABLE,
+		// but NUD_REACHABLE is fully dynamic and will be re-probed anyway.
+		if n.State == netlink.NUD_PERMANENT {
+			log.Debugf("Copying a static ARP entry: %+v %+v", n.IP, n.HardwareAddr)
+			// No flags are copied because Stack.AddStaticNeighbor does not support flags right now.
+			neighbors = append(neighbors, boot.Neighbor{IP: n.IP, HardwareAddr: n.HardwareAddr})
+		}
+	}
+	return neighbors, nil
+}
+
+// stealAddresses removes ipAddrs from iface and returns them.
+func stealAddresses(iface net.Interface, ifaceLink netlink.Link, ipAddrs []*net.IPNet) ([]boot.IPWithPrefix, error) {
+	var addresses []boot.IPWithPrefix
+	for _, addr := range ipAddrs {
+		prefix, _ := addr.Mask.Size()
+		addresses = append(addresses, boot.IPWithPrefix{Address: addr.IP, PrefixLen: prefix})
+
+		// Steal IP address from NIC.
+		if err := removeAddress(ifaceLink, addr.String()); err != nil {
+			// If we encounter an error while deleting the ip,
+			// verify the ip is still present on the interface.
+			if present, err := isAddressOnInterface(iface.Name, addr); err != nil {
+				return nil, fmt.Errorf("checking if address %v is on interface %q: %w", addr, iface.Name, err)
+			} else if !present {
+				continue
+			}
+			return nil, fmt.Errorf("removing address %v from device %q: %w", addr, iface.Name, err)
+		}
+	}
+	return addresses, nil
+}
+
+// createChannels creates the sockets backing the link.NumChannels channels of
+// link, and configures GSO for link accordingly. If iface is a TAP device, its
+// queues are used as channels instead.
+func createChannels(iface net.Interface, ifaceLink netlink.Link, link *boot.FDBasedLink, conf *config.Config) ([]*os.File, error) {
+	log.Debugf("Setting up network channels")
+	if tap, ok := ifaceLink.(*netlink.Tuntap); ok && tap.Mode == netlink.TUNTAP_MODE_TAP {
+		return createTAPChannels(iface, link, conf)
+	}
+	var files []*os.File
+	// Create the socket for the device.
+	for i := 0; i < link.NumChannels; i++ {
+		log.Debugf("Creating Channel %d", i)
+		socketEntry, err := createSocket(iface, ifaceLink, conf.HostGSO)
+		if err != nil {
+			return nil, fmt.Errorf("failed to createSocket for %s : %w", iface.Name, err)
+		}
+		if i == 0 {
+			link.GSOMaxSize = socketEntry.gsoMaxSize
+		} else {
+			if link.GSOMaxSize != socketEntry.gsoMaxSize {
+				return nil, fmt.Errorf("inconsistent gsoMaxSize %d and %d when creating multiple channels for same interface: %s",
+					link.GSOMaxSize, socketEntry.gsoMaxSize, iface.Name)
+			}
+		}
+		files = append(files, socketEntry.deviceFile)
+	}
+
+	if link.GSOMaxSize == 0 && conf.GvisorGSO {
+		// Host GSO is disabled. Let's enable gVisor GSO.
+		link.GSOMaxSize = stack.GvisorGSOMaxSize
+		link.GvisorGSOEnabled = true
+	}
+	return files, nil
+}
+
+// createTAPChannels opens link.NumChannels queues of the TAP device iface, and
+// configures GSO for link accordingly. More than one channel requires a
+// multi-queue TAP device, whose queues are selected by the host kernel by flow
+// hash.
+func createTAPChannels(iface net.Interface, link *boot.FDBasedLink, conf *config.Config) ([]*os.File, error) {
+	log.Debugf("Opening %d queues of TAP device %q", link.NumChannels, iface.Name)
+	fds, err := tun.OpenTAPQueues(iface.Name, link.NumChannels)
+	if err != nil {
+		return nil, fmt.Errorf("opening %d queues of TAP device %q: %w", link.NumChannels, iface.Name, err)
+	}
+	files := make([]*os.File, 0, len(fds))
+	for i, fd := range fds {
+		files = append(files, os.NewFile(uintptr(fd), fmt.Sprintf("%s-queue-%d", iface.Name, i)))
+	}
+
+	// Host GSO is only supported for packet sockets.
+	link.GSOMaxSize = 0
+	if conf.GvisorGSO {
+		link.GSOMaxSize = stack.GvisorGSOMaxSize
+		link.GvisorGSOEnabled = true
+	}
+	return files, nil
+}
+
+// attachInterfaceFromNS creates the interface with the given name, which was
+// added to the net namespace with the given path after the sandbox started,
+// in the running sandbox, and removes its addresses from the host.
+func attachInterfaceFromNS(conn *urpc.Client, nsPath, name string, conf *config.Config) error {
+	restore, err := joinNetNS(nsPath)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("getting interface %q: %w", name, err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("interface %q is down", name)
+	}
+	if iface.Flags&net.FlagLoopback != 0 {
+		return fmt.Errorf("cannot attach loopback interface %q", name)
+	}
+
+	allAddrs, err := iface.Addrs()
+	if err != nil {
+		return fmt.Errorf("fetching interface addresses for %q: %w", name, err)
+	}
+	var ipAddrs []*net.IPNet
+	for _, ifaddr := range allAddrs {
+		ipNet, ok := ifaddr.(*net.IPNet)
+		if !ok {
+			return fmt.Errorf("address is not IPNet: %+v", ifaddr)
+		}
+		ipAddrs = append(ipAddrs, ipNet)
+	}
+
+	neighbors, err := staticNeighbors(*iface)
+	if err != nil {
+		return err
+	}
+
+	// Scrape the routes before removing the address, since that will remove
+	// the routes as well. Default routes are kept with the other routes of
+	// the interface, since the sandbox may already have default routes.
+	routes, defv4, defv6, err := routesForIface(*iface)
+	if err != nil {
+		return fmt.Errorf("getting routes for interface %q: %v", name, err)
+	}
+	for _, def := range []*boot.Route{defv4, defv6} {
+		if def != nil {
+			routes = append(routes, *def)
+		}
+	}
+
+	ifaceLink, err := netlink.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("getting link for interface %q: %w", name, err)
+	}
+
+	args := boot.AttachNICArgs{
+		Link: boot.FDBasedLink{
+			Name:              name,
+			MTU:               iface.MTU,
+			Routes:            routes,
+			TXChecksumOffload: conf.TXChecksumOffload,
+			RXChecksumOffload: conf.RXChecksumOffload,
+			NumChannels:       conf.NumNetworkChannels,
+			QDisc:             conf.QDisc,
+			Neighbors:         neighbors,
+			LinkAddress:       ifaceLink.Attrs().HardwareAddr,
+		},
+	}
+	args.FilePayload.Files, err = createChannels(*iface, ifaceLink, &args.Link, conf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range args.FilePayload.Files {
+			_ = f.Close()
+		}
+	}()
+
+	args.Link.Addresses, err = stealAddresses(*iface, ifaceLink, ipAddrs)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Attaching network interface, config: %+v", args)
+	if err := conn.Call(boot.NetworkAttachNIC, &args, nil); err != nil {
+		return fmt.Errorf("attaching interface %q: %w", name, err)
+	}
+	return nil
+}
+
 // isAddressOnInterface checks if an address is on an interface
 func isAddressOnInterface(ifaceName string, addr *net.IPNet) (bool, error) {
 	iface, err := net.InterfaceByName(ifaceName)
@@ -516,6 +706,79 @@ func loopbackLink(iface net.Interface, addrs []net.Addr) (boot.LoopbackLink, err
 	return link, nil
 }
 
+// DummyLinkPrefix is the annotation prefix for dummy interfaces. Each
+// interface is configured with annotations of the form
+// "dev.gvisor.spec.net.dummy.<name>.<field>", where field is one of:
+//   - "addresses": a comma-separated list of addresses in CIDR notation.
+//   - "mtu": the MTU of the interface, defaults to 1500.
+const DummyLinkPrefix = "dev.gvisor.spec.net.dummy."
+
+// defaultDummyMTU is the default MTU of dummy interfaces, as in Linux.
+const defaultDummyMTU = 1500
+
+// dummyLinks returns the dummy links configured by spec's annotations, sorted
+// by name.
+func dummyLinks(spec *specs.Spec) ([]boot.DummyLink, error) {
+	links := make(map[string]*boot.DummyLink)
+	for k, v := range spec.Annotations {
+		if !strings.HasPrefix(k, DummyLinkPrefix) {
+			continue
+		}
+		parts := strings.Split(k[len(DummyLinkPrefix):], ".")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid dummy interface annotation: %s=%s", k, v)
+		}
+		name := parts[0]
+		// Interface names are limited to IFNAMSIZ-1 bytes, see
+		// net/core/dev.c:dev_valid_name().
+		if len(name) == 0 || len(name) >= linux.IFNAMSIZ || strings.ContainsAny(name, "/: \t\n") {
+			return nil, fmt.Errorf("invalid dummy interface name: %q", name)
+		}
+		link := links[name]
+		if link == nil {
+			link = &boot.DummyLink{Name: name, MTU: defaultDummyMTU}
+			links[name] = link
+		}
+		switch parts[1] {
+		case "addresses":
+			for _, a := range strings.Split(v, ",") {
+				ip, ipNet, err := net.ParseCIDR(strings.TrimSpace(a))
+				if err != nil {
+					return nil, fmt.Errorf("invalid address for dummy interface %q: %v", name, err)
+				}
+				prefix, _ := ipNet.Mask.Size()
+				link.Addresses = append(link.Addresses, boot.IPWithPrefix{
+					Address:   ip,
+					PrefixLen: prefix,
+				})
+				link.Routes = append(link.Routes, boot.Route{
+					Destination: *ipNet,
+				})
+			}
+		case "mtu":
+			mtu, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || mtu == 0 {
+				return nil, fmt.Errorf("invalid MTU for dummy interface %q: %q", name, v)
+			}
+			link.MTU = int(mtu)
+		default:
+			return nil, fmt.Errorf("invalid dummy interface annotation: %s=%s", k, v)
+		}
+	}
+
+	names := make([]string, 0, len(links))
+	for name := range links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rv := make([]boot.DummyLink, 0, len(names))
+	for _, name := range names {
+		log.Infof("Dummy interface annotation found, name: %s, MTU: %d, addresses: %v", name, links[name].MTU, links[name].Addresses)
+		rv = append(rv, *links[name])
+	}
+	return rv, nil
+}
+
 // routesForIface iterates over all routes for the given interface and converts
 // them to boot.Routes. It also returns the a default v4/v6 route if found.
 func routesForIface(iface net.Interface) ([]boot.Route, *boot.Route, *boot.Route, error) {
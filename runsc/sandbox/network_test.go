@@ -0,0 +1,139 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/boot"
+)
+
+func TestDummyLinks(t *testing.T) {
+	mustParseCIDR := func(s string) net.IPNet {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%q): %v", s, err)
+		}
+		return *ipNet
+	}
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		want        []boot.DummyLink
+		wantErr     bool
+	}{
+		{
+			name: "none",
+			annotations: map[string]string{
+				"dev.gvisor.spec.mount.foo.type": "bind",
+			},
+			want: []boot.DummyLink{},
+		},
+		{
+			name: "sorted",
+			annotations: map[string]string{
+				DummyLinkPrefix + "dummy1.addresses": "10.1.0.1/24, fd00::1/64",
+				DummyLinkPrefix + "dummy1.mtu":       "9000",
+				DummyLinkPrefix + "dummy0.addresses": "10.0.0.1/32",
+			},
+			want: []boot.DummyLink{
+				{
+					Name: "dummy0",
+					MTU:  1500,
+					Addresses: []boot.IPWithPrefix{
+						{Address: net.ParseIP("10.0.0.1"), PrefixLen: 32},
+					},
+					Routes: []boot.Route{
+						{Destination: mustParseCIDR("10.0.0.1/32")},
+					},
+				},
+				{
+					Name: "dummy1",
+					MTU:  9000,
+					Addresses: []boot.IPWithPrefix{
+						{Address: net.ParseIP("10.1.0.1"), PrefixLen: 24},
+						{Address: net.ParseIP("fd00::1"), PrefixLen: 64},
+					},
+					Routes: []boot.Route{
+						{Destination: mustParseCIDR("10.1.0.0/24")},
+						{Destination: mustParseCIDR("fd00::/64")},
+					},
+				},
+			},
+		},
+		{
+			name: "no addresses",
+			annotations: map[string]string{
+				DummyLinkPrefix + "dummy0.mtu": "1280",
+			},
+			want: []boot.DummyLink{{Name: "dummy0", MTU: 1280}},
+		},
+		{
+			name: "bad address",
+			annotations: map[string]string{
+				DummyLinkPrefix + "dummy0.addresses": "10.0.0.1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad mtu",
+			annotations: map[string]string{
+				DummyLinkPrefix + "dummy0.mtu": "0",
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad field",
+			annotations: map[string]string{
+				DummyLinkPrefix + "dummy0.foo": "bar",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing field",
+			annotations: map[string]string{
+				DummyLinkPrefix + "dummy0": "bar",
+			},
+			wantErr: true,
+		},
+		{
+			name: "long name",
+			annotations: map[string]string{
+				DummyLinkPrefix + "averyveryverylongname.mtu": "1500",
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := &specs.Spec{Annotations: tc.annotations}
+			got, err := dummyLinks(spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("dummyLinks() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("dummyLinks(): %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("dummyLinks() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -33,6 +34,7 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/syndtr/gocapability/capability"
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/cleanup"
 	"gvisor.dev/gvisor/pkg/control/client"
@@ -42,7 +44,11 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/seccheck"
+	"gvisor.dev/gvisor/pkg/sentry/state"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sentry/watchdog"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip/link/shaper"
 	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/boot/procfs"
@@ -112,6 +118,15 @@ type Sandbox struct {
 	// started, before it may be modified.
 	OriginalOOMScoreAdj int `json:"originalOomScoreAdj"`
 
+	// MetricSocket is the path of the unix domain socket on which the sandbox
+	// serves metrics. It is empty if the metric server is disabled.
+	MetricSocket string `json:"metricSocket"`
+
+	// VsockSocket is the path of the unix domain socket on which the sandbox
+	// accepts vsock connections from the host. It is empty if AF_VSOCK is
+	// disabled.
+	VsockSocket string `json:"vsockSocket"`
+
 	// child is set if a sandbox process is a child of the current process.
 	//
 	// This field isn't saved to json, because only a creator of sandbox
@@ -281,7 +296,7 @@ func (s *Sandbox) StartRoot(spec *specs.Spec, conf *config.Config) error {
 	defer conn.Close()
 
 	// Configure the network.
-	if err := setupNetwork(conn, pid, conf); err != nil {
+	if err := setupNetwork(conn, pid, spec, conf); err != nil {
 		return fmt.Errorf("setting up network: %v", err)
 	}
 
@@ -327,21 +342,28 @@ func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid s
 	return nil
 }
 
-// Restore sends the restore call for a container in the sandbox.
-func (s *Sandbox) Restore(cid string, spec *specs.Spec, conf *config.Config, filename string) error {
+// Restore sends the restore call for a container in the sandbox. The state is
+// read sequentially from rf, which may be a pipe or a socket.
+func (s *Sandbox) Restore(cid string, spec *specs.Spec, conf *config.Config, rf *os.File) error {
 	log.Debugf("Restore sandbox %q", s.ID)
 
-	rf, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("opening restore file %q failed: %v", filename, err)
-	}
-	defer rf.Close()
-
 	opt := boot.RestoreOpts{
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{rf},
 		},
-		SandboxID: s.ID,
+		LazyPages:     conf.RestoreLazyPages,
+		EncryptionKey: conf.RestoreEncryptionKey,
+		SandboxID:     s.ID,
+	}
+
+	if conf.RestorePagesFile != "" {
+		pf, err := os.Open(conf.RestorePagesFile)
+		if err != nil {
+			return fmt.Errorf("opening restore pages file %q failed: %v", conf.RestorePagesFile, err)
+		}
+		defer pf.Close()
+		opt.HavePagesFile = true
+		opt.FilePayload.Files = append(opt.FilePayload.Files, pf)
 	}
 
 	// If the platform needs a device FD we must pass it in.
@@ -359,7 +381,7 @@ func (s *Sandbox) Restore(cid string, spec *specs.Spec, conf *config.Config, fil
 	defer conn.Close()
 
 	// Configure the network.
-	if err := setupNetwork(conn, s.Pid.load(), conf); err != nil {
+	if err := setupNetwork(conn, s.Pid.load(), spec, conf); err != nil {
 		return fmt.Errorf("setting up network: %v", err)
 	}
 
@@ -421,19 +443,21 @@ func (s *Sandbox) CreateTraceSession(config *seccheck.SessionConfig, force bool)
 	return nil
 }
 
-// DeleteTraceSession deletes an existing trace session.
-func (s *Sandbox) DeleteTraceSession(name string) error {
+// DeleteTraceSession deletes an existing trace session and returns its final
+// status.
+func (s *Sandbox) DeleteTraceSession(name string) (*seccheck.SessionConfig, error) {
 	log.Debugf("Deleting trace session %q in sandbox %q", name, s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer conn.Close()
 
-	if err := conn.Call(boot.ContMgrDeleteTraceSession, name, nil); err != nil {
-		return fmt.Errorf("deleting trace session: %w", err)
+	var session seccheck.SessionConfig
+	if err := conn.Call(boot.ContMgrDeleteTraceSession, name, &session); err != nil {
+		return nil, fmt.Errorf("deleting trace session: %w", err)
 	}
-	return nil
+	return &session, nil
 }
 
 // ListTraceSessions lists all trace sessions.
@@ -468,6 +492,89 @@ func (s *Sandbox) ProcfsDump() ([]procfs.ProcessProcfsDump, error) {
 	return procfsDump, nil
 }
 
+// FDsDump writes the FD tables, mount tables and working directories of all
+// tasks in the sandbox to f as a stream of JSON objects.
+func (s *Sandbox) FDsDump(f *os.File) error {
+	log.Debugf("FDs dump %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	opts := boot.FDsDumpOpts{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+	}
+	if err := conn.Call(boot.ContMgrFDsDump, &opts, nil); err != nil {
+		return fmt.Errorf("dumping sandbox %q FDs: %v", s.ID, err)
+	}
+	return nil
+}
+
+// CopyIn extracts the tar stream read from r to path in container cid.
+func (s *Sandbox) CopyIn(cid, path string, r *os.File) error {
+	log.Debugf("Copy in to %q in container %q", path, cid)
+	return s.copyFiles(boot.ContMgrCopyIn, cid, path, r)
+}
+
+// CopyOut writes path in container cid to w as a tar stream.
+func (s *Sandbox) CopyOut(cid, path string, w *os.File) error {
+	log.Debugf("Copy out of %q in container %q", path, cid)
+	return s.copyFiles(boot.ContMgrCopyOut, cid, path, w)
+}
+
+func (s *Sandbox) copyFiles(method, cid, path string, f *os.File) error {
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.CopyArgs{
+		ContainerID: cid,
+		Path:        path,
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+	}
+	if err := conn.Call(method, &args, nil); err != nil {
+		return fmt.Errorf("copying %q in container %q: %w", path, cid, err)
+	}
+	return nil
+}
+
+// SetRealtimeOffset sets the offset of CLOCK_REALTIME in the sandbox from the
+// host's.
+func (s *Sandbox) SetRealtimeOffset(offset time.Duration) error {
+	log.Debugf("Set realtime offset of sandbox %q to %v", s.ID, offset)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SetRealtimeOffsetArgs{Offset: offset}
+	if err := conn.Call(boot.ContMgrSetRealtimeOffset, &args, nil); err != nil {
+		return fmt.Errorf("setting realtime offset of sandbox %q: %v", s.ID, err)
+	}
+	return nil
+}
+
+// AdvanceTime advances the virtual time of the sandbox, and returns its new
+// CLOCK_MONOTONIC time.
+func (s *Sandbox) AdvanceTime(args *boot.AdvanceTimeArgs) (time.Duration, error) {
+	log.Debugf("Advance time of sandbox %q: %+v", s.ID, args)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var now time.Duration
+	if err := conn.Call(boot.ContMgrAdvanceTime, args, &now); err != nil {
+		return 0, fmt.Errorf("advancing time of sandbox %q: %v", s.ID, err)
+	}
+	return now, nil
+}
+
 // NewCGroup returns the sandbox's Cgroup, or an error if it does not have one.
 func (s *Sandbox) NewCGroup() (cgroup.Cgroup, error) {
 	return cgroup.NewFromPid(s.Pid.load(), false /* useSystemd */)
@@ -505,16 +612,50 @@ func (s *Sandbox) Event(cid string) (*boot.EventOut, error) {
 	}
 	defer conn.Close()
 
+	return event(conn, cid)
+}
+
+func event(conn *urpc.Client, cid string) (*boot.EventOut, error) {
 	var e boot.EventOut
-	// TODO(b/129292330): Pass in the container id (cid) here. The sandbox
-	// should return events only for that container.
-	if err := conn.Call(boot.ContMgrEvent, nil, &e); err != nil {
+	// TODO(b/129292330): The sandbox should return events only for the given
+	// container. For now, cid is only used to select its network namespace.
+	if err := conn.Call(boot.ContMgrEvent, &cid, &e); err != nil {
 		return nil, fmt.Errorf("retrieving event data from sandbox: %v", err)
 	}
 	e.Event.ID = cid
 	return &e, nil
 }
 
+// EventStream is a long-lived connection to the sandbox control server that
+// is used to retrieve a sequence of events without dialing the control socket
+// for every sample.
+type EventStream struct {
+	cid  string
+	conn *urpc.Client
+}
+
+// NewEventStream connects to the sandbox and returns an EventStream for the
+// given container. The caller must call EventStream.Close when done.
+func (s *Sandbox) NewEventStream(cid string) (*EventStream, error) {
+	log.Debugf("Opening event stream for container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{cid: cid, conn: conn}, nil
+}
+
+// Next retrieves the current stats from the sandbox over the existing
+// connection.
+func (es *EventStream) Next() (*boot.EventOut, error) {
+	return event(es.conn, es.cid)
+}
+
+// Close closes the connection to the sandbox.
+func (es *EventStream) Close() {
+	es.conn.Close()
+}
+
 func (s *Sandbox) sandboxConnect() (*urpc.Client, error) {
 	log.Debugf("Connecting to sandbox %q", s.ID)
 	conn, err := client.ConnectTo(boot.ControlSocketAddr(s.ID))
@@ -612,6 +753,19 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	if err := donations.OpenAndDonate("trace-fd", conf.TraceFile, profFlags); err != nil {
 		return err
 	}
+	if conf.WatchdogAction&watchdog.Bundle != 0 && conf.DebugLog != "" {
+		// The watchdog writes its diagnostic bundle to the debug log
+		// directory.
+		dir := conf.DebugLog
+		if !strings.HasSuffix(dir, "/") {
+			dir = filepath.Dir(dir) + "/"
+		}
+		bundleFile, err := specutils.DebugLogFile(dir+"runsc.bundle.%TIMESTAMP%.tar", "", test)
+		if err != nil {
+			return fmt.Errorf("opening watchdog bundle file in %q: %v", dir, err)
+		}
+		donations.DonateAndClose("watchdog-bundle-fd", bundleFile)
+	}
 
 	// Create a socket for the control server and donate it to the sandbox.
 	addr := boot.ControlSocketAddr(s.ID)
@@ -622,6 +776,21 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	}
 	donations.DonateAndClose("controller-fd", os.NewFile(uintptr(sockFD), "control_server_socket"))
 
+	if conf.MetricServer {
+		// Create a socket for the metric server and donate it to the sandbox.
+		// Remove any socket left behind by a sandbox with the same ID.
+		path := boot.MetricSocketPath(conf.RootDir, s.ID)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing stale metric server socket %q: %w", path, err)
+		}
+		metricFD, err := server.CreateSocket(path)
+		if err != nil {
+			return fmt.Errorf("creating metric server socket for sandbox %q: %v", s.ID, err)
+		}
+		s.MetricSocket = path
+		donations.DonateAndClose("metric-server-fd", os.NewFile(uintptr(metricFD), "metric_server_socket"))
+	}
+
 	specFile, err := specutils.OpenSpec(args.BundleDir)
 	if err != nil {
 		return fmt.Errorf("cannot open spec file in bundle dir %v: %w", args.BundleDir, err)
@@ -632,6 +801,35 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 		return err
 	}
 	donations.DonateAndClose("sink-fds", args.SinkFiles...)
+	if err := donations.OpenAndDonate("compat-policy-fd", conf.CompatPolicy, os.O_RDONLY); err != nil {
+		return err
+	}
+
+	if conf.ConnectPolicySocket != "" {
+		policyFile, err := dialConnectPolicy(conf.ConnectPolicySocket)
+		if err != nil {
+			return err
+		}
+		donations.DonateAndClose("connect-policy-fd", policyFile)
+	}
+
+	if conf.VsockCID != 0 {
+		listenFile, dirFile, err := createVsockSocket(conf.VsockUDS)
+		if err != nil {
+			return err
+		}
+		s.VsockSocket = conf.VsockUDS
+		donations.DonateAndClose("vsock-listen-fd", listenFile)
+		donations.DonateAndClose("vsock-dir-fd", dirFile)
+	}
+
+	if conf.SwapDir != "" {
+		swapFile, err := createSwapFile(conf.SwapDir, conf.SwapSize)
+		if err != nil {
+			return err
+		}
+		donations.DonateAndClose("swap-fd", swapFile)
+	}
 
 	gPlatform, err := platform.Lookup(conf.Platform)
 	if err != nil {
@@ -914,8 +1112,15 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	return nil
 }
 
+// waitTimeoutGrace is how much longer than the requested timeout the client
+// waits for a response to a Wait or WaitPID RPC. The sandbox enforces the
+// timeout itself, so this only matters if the sandbox is unresponsive.
+const waitTimeoutGrace = time.Second
+
 // Wait waits for the containerized process to exit, and returns its WaitStatus.
-func (s *Sandbox) Wait(cid string) (unix.WaitStatus, error) {
+// If timeout is positive and the process hasn't exited within timeout, an
+// error wrapping boot.ErrWaitTimeout is returned.
+func (s *Sandbox) Wait(cid string, timeout time.Duration) (unix.WaitStatus, error) {
 	log.Debugf("Waiting for container %q in sandbox %q", cid, s.ID)
 
 	if conn, err := s.sandboxConnect(); err != nil {
@@ -931,7 +1136,11 @@ func (s *Sandbox) Wait(cid string) (unix.WaitStatus, error) {
 
 		// Try the Wait RPC to the sandbox.
 		var ws unix.WaitStatus
-		err = conn.Call(boot.ContMgrWait, &cid, &ws)
+		args := boot.WaitArgs{
+			CID:     cid,
+			Timeout: timeout,
+		}
+		err = callWait(conn, boot.ContMgrWait, &args, &ws, timeout)
 		conn.Close()
 		if err == nil {
 			if s.IsRootContainer(cid) {
@@ -942,8 +1151,9 @@ func (s *Sandbox) Wait(cid string) (unix.WaitStatus, error) {
 			// It worked!
 			return ws, nil
 		}
-		// See comment above.
-		if !s.IsRootContainer(cid) {
+		// See comment above. Falling back to waiting on the sandbox process
+		// would ignore the timeout.
+		if !s.IsRootContainer(cid) || errors.Is(err, boot.ErrWaitTimeout) {
 			return unix.WaitStatus(0), err
 		}
 
@@ -968,8 +1178,9 @@ func (s *Sandbox) Wait(cid string) (unix.WaitStatus, error) {
 }
 
 // WaitPID waits for process 'pid' in the container's sandbox and returns its
-// WaitStatus.
-func (s *Sandbox) WaitPID(cid string, pid int32) (unix.WaitStatus, error) {
+// WaitStatus. If timeout is positive and the process hasn't exited within
+// timeout, an error wrapping boot.ErrWaitTimeout is returned.
+func (s *Sandbox) WaitPID(cid string, pid int32, timeout time.Duration) (unix.WaitStatus, error) {
 	log.Debugf("Waiting for PID %d in sandbox %q", pid, s.ID)
 	var ws unix.WaitStatus
 	conn, err := s.sandboxConnect()
@@ -979,15 +1190,29 @@ func (s *Sandbox) WaitPID(cid string, pid int32) (unix.WaitStatus, error) {
 	defer conn.Close()
 
 	args := &boot.WaitPIDArgs{
-		PID: pid,
-		CID: cid,
+		PID:     pid,
+		CID:     cid,
+		Timeout: timeout,
 	}
-	if err := conn.Call(boot.ContMgrWaitPID, args, &ws); err != nil {
-		return ws, fmt.Errorf("waiting on PID %d in sandbox %q: %v", pid, s.ID, err)
+	if err := callWait(conn, boot.ContMgrWaitPID, args, &ws, timeout); err != nil {
+		return ws, fmt.Errorf("waiting on PID %d in sandbox %q: %w", pid, s.ID, err)
 	}
 	return ws, nil
 }
 
+// callWait calls a Wait or WaitPID RPC with the given timeout, and translates
+// timeouts enforced by either side into boot.ErrWaitTimeout.
+func callWait(conn *urpc.Client, method string, args interface{}, ws *unix.WaitStatus, timeout time.Duration) error {
+	if timeout > 0 {
+		timeout += waitTimeoutGrace
+	}
+	err := conn.CallTimeout(method, args, ws, timeout)
+	if err == urpc.ErrTimeout || err == (urpc.RemoteError{Message: boot.ErrWaitTimeout.Error()}) {
+		return boot.ErrWaitTimeout
+	}
+	return err
+}
+
 // IsRootContainer returns true if the specified container ID belongs to the
 // root container.
 func (s *Sandbox) IsRootContainer(cid string) bool {
@@ -1009,6 +1234,17 @@ func (s *Sandbox) destroy() error {
 		}
 	}
 
+	if s.MetricSocket != "" {
+		if err := os.Remove(s.MetricSocket); err != nil && !os.IsNotExist(err) {
+			log.Warningf("Failed to remove metric server socket %q: %v", s.MetricSocket, err)
+		}
+	}
+	if s.VsockSocket != "" {
+		if err := os.Remove(s.VsockSocket); err != nil && !os.IsNotExist(err) {
+			log.Warningf("Failed to remove vsock socket %q: %v", s.VsockSocket, err)
+		}
+	}
+
 	return nil
 }
 
@@ -1039,6 +1275,29 @@ func (s *Sandbox) SignalContainer(cid string, sig unix.Signal, all bool) error {
 	return nil
 }
 
+// KillAll sends sig to all processes in the container, waits up to timeout for
+// them to exit, and then sends SIGKILL to any processes that remain. It returns
+// true if SIGKILL had to be sent.
+func (s *Sandbox) KillAll(cid string, sig unix.Signal, timeout time.Duration) (bool, error) {
+	log.Debugf("Kill all processes in sandbox %q, container %q", s.ID, cid)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	args := boot.KillAllArgs{
+		CID:     cid,
+		Signo:   int32(sig),
+		Timeout: timeout,
+	}
+	var forced bool
+	if err := conn.Call(boot.ContMgrKillAll, &args, &forced); err != nil {
+		return false, fmt.Errorf("killing all processes in container %q: %v", cid, err)
+	}
+	return forced, nil
+}
+
 // SignalProcess sends the signal to a particular process in the container. If
 // fgProcess is true, then the signal is sent to the foreground process group
 // in the same session that PID belongs to. This is only valid if the process
@@ -1068,9 +1327,92 @@ func (s *Sandbox) SignalProcess(cid string, pid int32, sig unix.Signal, fgProces
 	return nil
 }
 
+// ResizeTTY sets the window size of the TTY attached to the given process in
+// the given container. If pid is 0, the TTY of the container init process is
+// resized.
+func (s *Sandbox) ResizeTTY(cid string, pid int32, ws linux.Winsize) error {
+	log.Debugf("Resize TTY of PID %d in container %q in sandbox %q", pid, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.ResizeTTYArgs{
+		CID:     cid,
+		PID:     pid,
+		Winsize: ws,
+	}
+	if err := conn.Call(boot.ContMgrResizeTTY, &args, nil); err != nil {
+		return fmt.Errorf("resizing TTY of container %q PID %d: %v", cid, pid, err)
+	}
+	return nil
+}
+
+// Resize changes the number of CPUs and the total memory of the sandbox. A
+// value of 0 leaves the corresponding resource unchanged.
+func (s *Sandbox) Resize(cpus uint, totalMem uint64) error {
+	log.Debugf("Resize sandbox %q, CPUs: %d, total memory: %d", s.ID, cpus, totalMem)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.ResizeArgs{
+		CPUs:     cpus,
+		TotalMem: totalMem,
+	}
+	if err := conn.Call(boot.ContMgrResize, &args, nil); err != nil {
+		return fmt.Errorf("resizing sandbox %q: %v", s.ID, err)
+	}
+	return nil
+}
+
+// SetIOLimits changes the file I/O limits of container cid in the sandbox.
+func (s *Sandbox) SetIOLimits(cid string, limits usage.IOLimits) error {
+	log.Debugf("Set I/O limits of container %q in sandbox %q to %+v", cid, s.ID, limits)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SetIOLimitsArgs{
+		CID:    cid,
+		Limits: limits,
+	}
+	if err := conn.Call(boot.ContMgrSetIOLimits, &args, nil); err != nil {
+		return fmt.Errorf("setting I/O limits of container %q: %v", cid, err)
+	}
+	return nil
+}
+
+// ReconnectGofer reconnects the filesystems of container cid in the sandbox to
+// a new gofer over goferFiles.
+func (s *Sandbox) ReconnectGofer(cid string, goferFiles []*os.File) error {
+	log.Debugf("Reconnect gofer of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.ReconnectGoferArgs{
+		CID:         cid,
+		FilePayload: urpc.FilePayload{Files: goferFiles},
+	}
+	if err := conn.Call(boot.ContMgrReconnectGofer, &args, nil); err != nil {
+		return fmt.Errorf("reconnecting gofer of container %q: %v", cid, err)
+	}
+	return nil
+}
+
 // Checkpoint sends the checkpoint call for a container in the sandbox.
-// The statefile will be written to f.
-func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
+// The statefile will be written to f, and the contents of memory to
+// pagesFile if it is not nil. If key is not nil, the statefile is encrypted
+// with it.
+func (s *Sandbox) Checkpoint(cid string, f, pagesFile *os.File, key []byte, resume bool) error {
 	log.Debugf("Checkpoint sandbox %q", s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
@@ -1082,6 +1424,11 @@ func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{f},
 		},
+		EncryptionKey: key,
+		Resume:        resume,
+	}
+	if pagesFile != nil {
+		opt.FilePayload.Files = append(opt.FilePayload.Files, pagesFile)
 	}
 
 	if err := conn.Call(boot.ContMgrCheckpoint, &opt, nil); err != nil {
@@ -1090,16 +1437,41 @@ func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
 	return nil
 }
 
+// Migrate migrates the sandbox to the live migration destination connected to
+// by conn.
+func (s *Sandbox) Migrate(conn *os.File, maxRounds int, dirtyThreshold uint64) (state.MigrationStats, error) {
+	log.Debugf("Migrate sandbox %q", s.ID)
+	c, err := s.sandboxConnect()
+	if err != nil {
+		return state.MigrationStats{}, err
+	}
+	defer c.Close()
+
+	opt := control.MigrateOpts{
+		MaxRounds:      maxRounds,
+		DirtyThreshold: dirtyThreshold,
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{conn},
+		},
+	}
+	var stats state.MigrationStats
+	if err := c.Call(boot.ContMgrMigrate, &opt, &stats); err != nil {
+		return state.MigrationStats{}, fmt.Errorf("migrating sandbox %q: %v", s.ID, err)
+	}
+	return stats, nil
+}
+
 // Pause sends the pause call for a container in the sandbox.
 func (s *Sandbox) Pause(cid string) error {
-	log.Debugf("Pause sandbox %q", s.ID)
+	log.Debugf("Pause container %q in sandbox %q", cid, s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	if err := conn.Call(boot.LifecyclePause, nil, nil); err != nil {
+	args := control.ContainerArgs{ContainerID: cid}
+	if err := conn.Call(boot.LifecyclePause, &args, nil); err != nil {
 		return fmt.Errorf("pausing container %q: %v", cid, err)
 	}
 	return nil
@@ -1107,14 +1479,15 @@ func (s *Sandbox) Pause(cid string) error {
 
 // Resume sends the resume call for a container in the sandbox.
 func (s *Sandbox) Resume(cid string) error {
-	log.Debugf("Resume sandbox %q", s.ID)
+	log.Debugf("Resume container %q in sandbox %q", cid, s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	if err := conn.Call(boot.LifecycleResume, nil, nil); err != nil {
+	args := control.ContainerArgs{ContainerID: cid}
+	if err := conn.Call(boot.LifecycleResume, &args, nil); err != nil {
 		return fmt.Errorf("resuming container %q: %v", cid, err)
 	}
 	return nil
@@ -1122,7 +1495,13 @@ func (s *Sandbox) Resume(cid string) error {
 
 // Usage sends the collect call for a container in the sandbox.
 func (s *Sandbox) Usage(Full bool) (control.MemoryUsage, error) {
-	log.Debugf("Usage sandbox %q", s.ID)
+	return s.UsageTimeout(Full, 0)
+}
+
+// UsageTimeout is like Usage, but fails with urpc.ErrTimeout if the sandbox
+// doesn't respond within timeout. A timeout of 0 waits indefinitely.
+func (s *Sandbox) UsageTimeout(Full bool, timeout time.Duration) (control.MemoryUsage, error) {
+	log.Debugf("Usage sandbox %q, timeout: %v", s.ID, timeout)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return control.MemoryUsage{}, err
@@ -1130,12 +1509,28 @@ func (s *Sandbox) Usage(Full bool) (control.MemoryUsage, error) {
 	defer conn.Close()
 
 	var m control.MemoryUsage
-	err = conn.Call(boot.UsageCollect, &control.MemoryUsageOpts{
+	err = conn.CallTimeout(boot.UsageCollect, &control.MemoryUsageOpts{
 		Full: Full,
-	}, &m)
+	}, &m, timeout)
 	return m, err
 }
 
+// MemoryBreakdown returns a breakdown of the memory used by the sandbox.
+func (s *Sandbox) MemoryBreakdown() (*control.MemoryBreakdown, error) {
+	log.Debugf("Memory breakdown sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var m control.MemoryBreakdown
+	if err := conn.Call(boot.UsageMemoryBreakdown, &control.MemoryBreakdownOpts{}, &m); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q memory breakdown: %v", s.ID, err)
+	}
+	return &m, nil
+}
+
 // UsageFD sends the usagefd call for a container in the sandbox.
 func (s *Sandbox) UsageFD() (*control.MemoryUsageRecord, error) {
 	log.Debugf("Usage sandbox %q", s.ID)
@@ -1202,6 +1597,130 @@ func (s *Sandbox) Stacks() (string, error) {
 	return stacks, nil
 }
 
+// ExportMetrics returns a snapshot of the sandbox's metrics in the Prometheus
+// text exposition format.
+func (s *Sandbox) ExportMetrics() (string, error) {
+	log.Debugf("Export metrics sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	var metrics string
+	if err := conn.Call(boot.DebugMetrics, nil, &metrics); err != nil {
+		return "", fmt.Errorf("exporting sandbox %q metrics: %v", s.ID, err)
+	}
+	return metrics, nil
+}
+
+// NetworkStats returns the counters and state of the sandbox's network stack.
+func (s *Sandbox) NetworkStats() (*boot.NetworkStatsOut, error) {
+	log.Debugf("Network stats sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var stats boot.NetworkStatsOut
+	if err := conn.Call(boot.NetworkStats, nil, &stats); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q network stats: %v", s.ID, err)
+	}
+	return &stats, nil
+}
+
+// ConnTrack returns the connection tracking table of the sandbox's network
+// stack.
+func (s *Sandbox) ConnTrack() (*boot.ConnTrackOut, error) {
+	log.Debugf("Conntrack sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var out boot.ConnTrackOut
+	if err := conn.Call(boot.NetworkConnTrack, nil, &out); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q conntrack table: %v", s.ID, err)
+	}
+	return &out, nil
+}
+
+// CompatReport returns a summary of the unimplemented syscalls invoked in the
+// sandbox.
+func (s *Sandbox) CompatReport() (*boot.CompatReport, error) {
+	log.Debugf("Compat report sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var report boot.CompatReport
+	if err := conn.Call(boot.DebugCompatReport, nil, &report); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q compat report: %v", s.ID, err)
+	}
+	return &report, nil
+}
+
+// AttachNIC moves the host interface with the given name, which was added to
+// the sandbox's network namespace after the sandbox started, into the
+// sandbox's network stack.
+func (s *Sandbox) AttachNIC(name string, conf *config.Config) error {
+	log.Debugf("Attach interface %q to sandbox %q", name, s.ID)
+	if conf.Network != config.NetworkSandbox {
+		return fmt.Errorf("attaching interfaces requires network type %q, got %q", config.NetworkSandbox, conf.Network)
+	}
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	nsPath := filepath.Join("/proc", strconv.Itoa(s.Getpid()), "ns/net")
+	if err := attachInterfaceFromNS(conn, nsPath, name, conf); err != nil {
+		return fmt.Errorf("attaching interface %q to sandbox %q: %v", name, s.ID, err)
+	}
+	return nil
+}
+
+// DetachNIC removes the interface with the given name from the sandbox's
+// network stack.
+func (s *Sandbox) DetachNIC(name string) error {
+	log.Debugf("Detach interface %q from sandbox %q", name, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.NetworkDetachNIC, &boot.DetachNICArgs{Name: name}, nil); err != nil {
+		return fmt.Errorf("detaching interface %q from sandbox %q: %v", name, s.ID, err)
+	}
+	return nil
+}
+
+// SetBandwidth changes the bandwidth limits of the sandbox's external
+// interfaces. The limit of a direction is not changed if nil.
+func (s *Sandbox) SetBandwidth(ingress, egress *shaper.Limit) error {
+	log.Debugf("Set bandwidth limits of sandbox %q to ingress: %+v, egress: %+v", s.ID, ingress, egress)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SetBandwidthArgs{
+		Ingress: ingress,
+		Egress:  egress,
+	}
+	if err := conn.Call(boot.NetworkSetBandwidth, &args, nil); err != nil {
+		return fmt.Errorf("setting bandwidth limits of sandbox %q: %v", s.ID, err)
+	}
+	return nil
+}
+
 // HeapProfile writes a heap profile to the given file.
 func (s *Sandbox) HeapProfile(f *os.File, delay time.Duration) error {
 	log.Debugf("Heap profile %q", s.ID)
@@ -1234,8 +1753,9 @@ func (s *Sandbox) CPUProfile(f *os.File, duration time.Duration) error {
 	return conn.Call(boot.ProfileCPU, &opts, nil)
 }
 
-// BlockProfile writes a block profile to the given file.
-func (s *Sandbox) BlockProfile(f *os.File, duration time.Duration) error {
+// BlockProfile writes a block profile to the given file. Block profiling is
+// enabled at the given rate for duration; a rate of 0 uses the default rate.
+func (s *Sandbox) BlockProfile(f *os.File, duration time.Duration, rate int) error {
 	log.Debugf("Block profile %q", s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
@@ -1246,12 +1766,15 @@ func (s *Sandbox) BlockProfile(f *os.File, duration time.Duration) error {
 	opts := control.BlockProfileOpts{
 		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
 		Duration:    duration,
+		Rate:        rate,
 	}
 	return conn.Call(boot.ProfileBlock, &opts, nil)
 }
 
-// MutexProfile writes a mutex profile to the given file.
-func (s *Sandbox) MutexProfile(f *os.File, duration time.Duration) error {
+// MutexProfile writes a mutex profile to the given file. Mutex profiling is
+// enabled with the given fraction for duration; a fraction of 0 uses the
+// default fraction.
+func (s *Sandbox) MutexProfile(f *os.File, duration time.Duration, fraction int) error {
 	log.Debugf("Mutex profile %q", s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
@@ -1262,6 +1785,7 @@ func (s *Sandbox) MutexProfile(f *os.File, duration time.Duration) error {
 	opts := control.MutexProfileOpts{
 		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
 		Duration:    duration,
+		Fraction:    fraction,
 	}
 	return conn.Call(boot.ProfileMutex, &opts, nil)
 }
@@ -1297,6 +1821,36 @@ func (s *Sandbox) ChangeLogging(args control.LoggingArgs) error {
 	return nil
 }
 
+// DumpLogs writes the recent log statements retained by the sandbox to f.
+func (s *Sandbox) DumpLogs(f *os.File) error {
+	log.Debugf("Dump logs %q", s.ID)
+	return s.logs(boot.LoggingDump, f)
+}
+
+// FollowLogs streams log statements to f as the sandbox emits them. It
+// returns once writing to f fails in the sandbox, e.g. when f is the write end
+// of a pipe whose read end was closed.
+func (s *Sandbox) FollowLogs(f *os.File) error {
+	log.Debugf("Follow logs %q", s.ID)
+	return s.logs(boot.LoggingFollow, f)
+}
+
+func (s *Sandbox) logs(method string, f *os.File) error {
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := control.LogsArgs{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+	}
+	if err := conn.Call(method, &args, nil); err != nil {
+		return fmt.Errorf("retrieving sandbox %q logs: %v", s.ID, err)
+	}
+	return nil
+}
+
 // DestroyContainer destroys the given container. If it is the root container,
 // then the entire sandbox is destroyed.
 func (s *Sandbox) DestroyContainer(cid string) error {
@@ -1397,6 +1951,64 @@ func deviceFileForPlatform(name, devicePath string) (*os.File, error) {
 	return f, nil
 }
 
+// createSwapFile creates an unlinked file of the given size in dir, to be used
+// as the sentry's swap file. The file's disk space is reserved upfront, so
+// that swapping doesn't fail because the host filesystem is full.
+func createSwapFile(dir string, size uint64) (*os.File, error) {
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("creating swap file in %q: %w", dir, err)
+	}
+	f := os.NewFile(uintptr(fd), "swap file")
+	if err := unix.Fallocate(fd, 0, 0, int64(size)); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("reserving %d bytes for swap file in %q: %w", size, dir, err)
+	}
+	return f, nil
+}
+
+// createVsockSocket creates a unix domain socket listening at path for vsock
+// connections from the host, and opens the directory containing it, through
+// which the sandbox connects to the host.
+func createVsockSocket(path string) (*os.File, *os.File, error) {
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating vsock socket: %w", err)
+	}
+	listenFile := os.NewFile(uintptr(fd), "vsock_listen_socket")
+	if err := unix.Bind(fd, &unix.SockaddrUnix{Name: path}); err != nil {
+		_ = listenFile.Close()
+		return nil, nil, fmt.Errorf("binding vsock socket to %q: %w", path, err)
+	}
+	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		_ = listenFile.Close()
+		_ = os.Remove(path)
+		return nil, nil, fmt.Errorf("listening on vsock socket %q: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	dirFD, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		_ = listenFile.Close()
+		_ = os.Remove(path)
+		return nil, nil, fmt.Errorf("opening vsock socket directory %q: %w", dir, err)
+	}
+	return listenFile, os.NewFile(uintptr(dirFD), "vsock_dir"), nil
+}
+
+// dialConnectPolicy connects to the connect policy server listening on the
+// unix domain socket at path.
+func dialConnectPolicy(path string) (*os.File, error) {
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("creating connect policy socket: %w", err)
+	}
+	if err := unix.Connect(fd, &unix.SockaddrUnix{Name: path}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("connecting to connect policy server %q: %w", path, err)
+	}
+	return os.NewFile(uintptr(fd), "connect_policy_socket"), nil
+}
+
 // checkBinaryPermissions verifies that the required binary bits are set on
 // the runsc executable.
 func checkBinaryPermissions(conf *config.Config) error {
@@ -15,9 +15,11 @@
 package specutils
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/bits"
 	"path"
+	"strconv"
 	"strings"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -162,3 +164,103 @@ func validatePropagation(opt string) error {
 	}
 	return nil
 }
+
+// Options that record the ID mappings of idmapped mounts. Each option holds
+// one mapping as "<containerID>:<hostID>:<size>".
+const (
+	uidMapOption = "uidmap"
+	gidMapOption = "gidmap"
+)
+
+// mountIDMappings holds the ID mapping fields of a mount in the spec. The
+// version of the runtime spec that runsc builds with doesn't have them.
+type mountIDMappings struct {
+	UIDMappings []specs.LinuxIDMapping `json:"uidMappings,omitempty"`
+	GIDMappings []specs.LinuxIDMapping `json:"gidMappings,omitempty"`
+}
+
+// addMountIDMappings reads the uidMappings and gidMappings fields of the mounts
+// in the spec encoded in specBytes, and records them as options of the
+// corresponding mounts in spec, so that they are retained when the spec is
+// passed around.
+func addMountIDMappings(specBytes []byte, spec *specs.Spec) error {
+	var raw struct {
+		Mounts []mountIDMappings `json:"mounts"`
+	}
+	if err := json.Unmarshal(specBytes, &raw); err != nil {
+		return fmt.Errorf("error unmarshaling mount ID mappings: %v", err)
+	}
+	if len(raw.Mounts) != len(spec.Mounts) {
+		return fmt.Errorf("spec has %d mounts, but %d mount ID mappings", len(spec.Mounts), len(raw.Mounts))
+	}
+	for i, idm := range raw.Mounts {
+		if len(idm.UIDMappings) == 0 && len(idm.GIDMappings) == 0 {
+			continue
+		}
+		m := &spec.Mounts[i]
+		// As with runc, only bind mounts can be idmapped, and both mappings
+		// must be given.
+		if !IsGoferMount(*m) {
+			return fmt.Errorf("mount %q: uidMappings and gidMappings are only supported for bind mounts", m.Destination)
+		}
+		if len(idm.UIDMappings) == 0 || len(idm.GIDMappings) == 0 {
+			return fmt.Errorf("mount %q: both uidMappings and gidMappings must be set", m.Destination)
+		}
+		for _, idMap := range idm.UIDMappings {
+			if idMap.Size == 0 {
+				return fmt.Errorf("mount %q: invalid UID mapping with size 0", m.Destination)
+			}
+			m.Options = append(m.Options, idMappingOption(uidMapOption, idMap))
+		}
+		for _, idMap := range idm.GIDMappings {
+			if idMap.Size == 0 {
+				return fmt.Errorf("mount %q: invalid GID mapping with size 0", m.Destination)
+			}
+			m.Options = append(m.Options, idMappingOption(gidMapOption, idMap))
+		}
+	}
+	return nil
+}
+
+func idMappingOption(name string, idMap specs.LinuxIDMapping) string {
+	return fmt.Sprintf("%s=%d:%d:%d", name, idMap.ContainerID, idMap.HostID, idMap.Size)
+}
+
+// IsIDMappingOption returns true if the mount option opt records an ID mapping
+// of an idmapped mount.
+func IsIDMappingOption(opt string) bool {
+	key := moptKey(opt)
+	return key == uidMapOption || key == gidMapOption
+}
+
+// MountIDMappings returns the UID and GID mappings of an idmapped mount. Each
+// mapping presents files owned by host IDs starting at HostID as owned by IDs
+// starting at ContainerID. Both are empty if m isn't idmapped.
+func MountIDMappings(m *specs.Mount) ([]specs.LinuxIDMapping, []specs.LinuxIDMapping, error) {
+	var uids, gids []specs.LinuxIDMapping
+	for _, opt := range m.Options {
+		key := moptKey(opt)
+		if key != uidMapOption && key != gidMapOption {
+			continue
+		}
+		fields := strings.Split(strings.TrimPrefix(opt, key+"="), ":")
+		if len(fields) != 3 {
+			return nil, nil, fmt.Errorf("invalid mount option %q", opt)
+		}
+		var ids [3]uint32
+		for i, f := range fields {
+			id, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid mount option %q: %v", opt, err)
+			}
+			ids[i] = uint32(id)
+		}
+		idMap := specs.LinuxIDMapping{ContainerID: ids[0], HostID: ids[1], Size: ids[2]}
+		if key == uidMapOption {
+			uids = append(uids, idMap)
+		} else {
+			gids = append(gids, idMap)
+		}
+	}
+	return uids, gids, nil
+}
@@ -106,6 +106,27 @@ func FilterNS(filter []specs.LinuxNamespaceType, s *specs.Spec) []specs.LinuxNam
 	return out
 }
 
+// nsGetNSType is the NS_GET_NSTYPE ioctl, see ioctl_ns(2).
+const nsGetNSType = 0xb703
+
+// ValidateNSPath checks that ns.Path refers to a namespace of type ns.Type,
+// without joining it.
+func ValidateNSPath(ns specs.LinuxNamespace) error {
+	f, err := os.Open(ns.Path)
+	if err != nil {
+		return fmt.Errorf("error opening %q: %v", ns.Path, err)
+	}
+	defer f.Close()
+	nsType, err := unix.IoctlRetInt(int(f.Fd()), nsGetNSType)
+	if err != nil {
+		return fmt.Errorf("%q is not a namespace: %v", ns.Path, err)
+	}
+	if uintptr(nsType) != nsCloneFlag(ns.Type) {
+		return fmt.Errorf("%q is not a %v namespace", ns.Path, ns.Type)
+	}
+	return nil
+}
+
 // setNS sets the namespace of the given type.  It must be called with
 // OSThreadLocked.
 func setNS(fd, nsType uintptr) error {
@@ -30,22 +30,28 @@ import (
 )
 
 var (
-	killThreadAction = linux.SECCOMP_RET_KILL_THREAD
-	trapAction       = linux.SECCOMP_RET_TRAP
-	// runc always returns EPERM as the errorcode for SECCOMP_RET_ERRNO
+	killProcessAction = linux.SECCOMP_RET_KILL_PROCESS
+	killThreadAction  = linux.SECCOMP_RET_KILL_THREAD
+	trapAction        = linux.SECCOMP_RET_TRAP
+	// runc returns EPERM as the errorcode for SECCOMP_RET_ERRNO unless
+	// errnoRet is set.
 	errnoAction = linux.SECCOMP_RET_ERRNO.WithReturnCode(uint16(unix.EPERM))
 	// runc always returns EPERM as the errorcode for SECCOMP_RET_TRACE
 	traceAction = linux.SECCOMP_RET_TRACE.WithReturnCode(uint16(unix.EPERM))
+	logAction   = linux.SECCOMP_RET_LOG
 	allowAction = linux.SECCOMP_RET_ALLOW
 )
 
 // BuildProgram generates a bpf program based on the given OCI seccomp
 // config.
 func BuildProgram(s *specs.LinuxSeccomp) (bpf.Program, error) {
-	defaultAction, err := convertAction(s.DefaultAction)
+	defaultAction, err := convertAction(s.DefaultAction, s.DefaultErrnoRet)
 	if err != nil {
 		return bpf.Program{}, fmt.Errorf("secomp default action: %w", err)
 	}
+	if err := checkArchitectures(s.Architectures); err != nil {
+		return bpf.Program{}, err
+	}
 	ruleset, err := convertRules(s)
 	if err != nil {
 		return bpf.Program{}, fmt.Errorf("invalid seccomp rules: %w", err)
@@ -84,18 +90,65 @@ func lookupSyscallNo(arch uint32, name string) (uint32, error) {
 	return uint32(n), nil
 }
 
-// convertAction converts a LinuxSeccompAction to BPFAction
-func convertAction(act specs.LinuxSeccompAction) (linux.BPFAction, error) {
-	// TODO(gvisor.dev/issue/3124): Update specs package to include ActLog and ActKillProcess.
+// knownArchs is the set of architecture names known to libseccomp.
+var knownArchs = map[specs.Arch]struct{}{
+	specs.ArchX86:         {},
+	specs.ArchX86_64:      {},
+	specs.ArchX32:         {},
+	specs.ArchARM:         {},
+	specs.ArchAARCH64:     {},
+	specs.ArchMIPS:        {},
+	specs.ArchMIPS64:      {},
+	specs.ArchMIPS64N32:   {},
+	specs.ArchMIPSEL:      {},
+	specs.ArchMIPSEL64:    {},
+	specs.ArchMIPSEL64N32: {},
+	specs.ArchPPC:         {},
+	specs.ArchPPC64:       {},
+	specs.ArchPPC64LE:     {},
+	specs.ArchS390:        {},
+	specs.ArchS390X:       {},
+	specs.ArchPARISC:      {},
+	specs.ArchPARISC64:    {},
+	specs.ArchRISCV64:     {},
+}
+
+// checkArchitectures checks that all architectures in archs are known.
+//
+// As in libseccomp, the native architecture is always allowed, and system
+// calls made with any other architecture's calling convention, which the
+// sentry doesn't support, result in the bad architecture action.
+func checkArchitectures(archs []specs.Arch) error {
+	for _, arch := range archs {
+		if _, ok := knownArchs[arch]; !ok {
+			return fmt.Errorf("unsupported architecture: %q", arch)
+		}
+	}
+	return nil
+}
+
+// convertAction converts a LinuxSeccompAction to BPFAction. errnoRet is the
+// errno returned by ActErrno; if it is nil, EPERM is returned.
+func convertAction(act specs.LinuxSeccompAction, errnoRet *uint) (linux.BPFAction, error) {
 	switch act {
-	case specs.ActKill:
+	case specs.ActKill, specs.ActKillThread:
 		return killThreadAction, nil
+	case specs.ActKillProcess:
+		return killProcessAction, nil
 	case specs.ActTrap:
 		return trapAction, nil
 	case specs.ActErrno:
+		if errnoRet != nil {
+			if *errnoRet > linux.SECCOMP_RET_DATA {
+				return 0, fmt.Errorf("invalid errno: %d", *errnoRet)
+			}
+			return linux.SECCOMP_RET_ERRNO.WithReturnCode(uint16(*errnoRet)), nil
+		}
 		return errnoAction, nil
 	case specs.ActTrace:
 		return traceAction, nil
+	case specs.ActLog:
+		return logAction, nil
 	case specs.ActAllow:
 		return allowAction, nil
 	default:
@@ -108,14 +161,14 @@ func convertAction(act specs.LinuxSeccompAction) (linux.BPFAction, error) {
 func convertRules(s *specs.LinuxSeccomp) ([]seccomp.RuleSet, error) {
 	// NOTE: Architectures are only really relevant when calling 32bit syscalls
 	// on a 64bit system. Since we don't support that in gVisor anyway, we
-	// ignore Architectures and only test against the native architecture.
+	// only test against the native architecture; see checkArchitectures.
 
 	ruleset := []seccomp.RuleSet{}
 
 	for _, syscall := range s.Syscalls {
 		sysRules := seccomp.NewSyscallRules()
 
-		action, err := convertAction(syscall.Action)
+		action, err := convertAction(syscall.Action, syscall.ErrnoRet)
 		if err != nil {
 			return nil, err
 		}
@@ -155,7 +208,7 @@ func convertArgs(args []specs.LinuxSeccompArg) ([]seccomp.Rule, error) {
 	argCounts := make([]uint, 6)
 
 	for _, arg := range args {
-		if arg.Index > 6 {
+		if arg.Index >= 6 {
 			return nil, fmt.Errorf("invalid index: %d", arg.Index)
 		}
 
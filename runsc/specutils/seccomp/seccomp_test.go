@@ -371,7 +371,104 @@ var (
 			input:    testInput(nativeArchAuditNo, "clone", &[6]uint64{0x50f00}),
 			expected: uint32(allowAction),
 		},
+		{
+			name: "errno_ret",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Syscalls: []specs.LinuxSyscall{
+					{
+						Names: []string{
+							"getcwd",
+						},
+						Action:   specs.ActErrno,
+						ErrnoRet: &enosys,
+					},
+				},
+			},
+			input:    testInput(nativeArchAuditNo, "getcwd", nil),
+			expected: uint32(linux.SECCOMP_RET_ERRNO.WithReturnCode(uint16(unix.ENOSYS))),
+		},
+		{
+			name: "default_errno_ret",
+			config: specs.LinuxSeccomp{
+				DefaultAction:   specs.ActErrno,
+				DefaultErrnoRet: &enosys,
+			},
+			input:    testInput(nativeArchAuditNo, "read", nil),
+			expected: uint32(linux.SECCOMP_RET_ERRNO.WithReturnCode(uint16(unix.ENOSYS))),
+		},
+		{
+			name: "match_name_kill_process",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Syscalls: []specs.LinuxSyscall{
+					{
+						Names: []string{
+							"getcwd",
+						},
+						Action: specs.ActKillProcess,
+					},
+				},
+			},
+			input:    testInput(nativeArchAuditNo, "getcwd", nil),
+			expected: uint32(killProcessAction),
+		},
+		{
+			name: "match_name_kill_thread",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Syscalls: []specs.LinuxSyscall{
+					{
+						Names: []string{
+							"getcwd",
+						},
+						Action: specs.ActKillThread,
+					},
+				},
+			},
+			input:    testInput(nativeArchAuditNo, "getcwd", nil),
+			expected: uint32(killThreadAction),
+		},
+		{
+			name: "match_name_log",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Syscalls: []specs.LinuxSyscall{
+					{
+						Names: []string{
+							"getcwd",
+						},
+						Action: specs.ActLog,
+					},
+				},
+			},
+			input:    testInput(nativeArchAuditNo, "getcwd", nil),
+			expected: uint32(logAction),
+		},
+		{
+			name: "architectures",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActErrno,
+				Architectures: []specs.Arch{
+					specs.ArchX86_64,
+					specs.ArchX86,
+					specs.ArchX32,
+				},
+				Syscalls: []specs.LinuxSyscall{
+					{
+						Names: []string{
+							"getcwd",
+						},
+						Action: specs.ActAllow,
+					},
+				},
+			},
+			input:    testInput(nativeArchAuditNo, "getcwd", nil),
+			expected: uint32(allowAction),
+		},
 	}
+
+	enosys = uint(unix.ENOSYS)
 )
 
 // TestRunscSeccomp generates seccomp programs from OCI config and executes
@@ -391,6 +488,54 @@ func TestRunscSeccomp(t *testing.T) {
 	}
 }
 
+// TestInvalidConfig checks that invalid OCI configs are rejected.
+func TestInvalidConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config specs.LinuxSeccomp
+	}{
+		{
+			name: "bad_action",
+			config: specs.LinuxSeccomp{
+				DefaultAction: "SCMP_ACT_BAD",
+			},
+		},
+		{
+			name: "bad_arch",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Architectures: []specs.Arch{"SCMP_ARCH_BAD"},
+			},
+		},
+		{
+			name: "bad_arg_index",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Syscalls: []specs.LinuxSyscall{
+					{
+						Names: []string{
+							"getcwd",
+						},
+						Args: []specs.LinuxSeccompArg{
+							{
+								Index: 6,
+								Op:    specs.OpEqualTo,
+							},
+						},
+						Action: specs.ActErrno,
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := BuildProgram(&tc.config); err == nil {
+				t.Errorf("BuildProgram(%+v) succeeded, want error", tc.config)
+			}
+		})
+	}
+}
+
 // checkProgram runs the given program over the given input and checks the
 // result against the expected output.
 func checkProgram(p bpf.Program, in bpf.Input, expected uint32) error {
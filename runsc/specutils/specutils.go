@@ -118,6 +118,9 @@ func ValidateSpec(spec *specs.Spec) error {
 			return err
 		}
 	}
+	if _, err := Personality(spec); err != nil {
+		return err
+	}
 	for _, m := range spec.Mounts {
 		if err := validateMount(&m); err != nil {
 			return err
@@ -141,6 +144,27 @@ func ValidateSpec(spec *specs.Spec) error {
 	return nil
 }
 
+// Personality returns the personality(2) of the container's processes, as
+// configured by spec.Linux.Personality.
+func Personality(spec *specs.Spec) (uint32, error) {
+	if spec.Linux == nil || spec.Linux.Personality == nil {
+		return linux.PER_LINUX, nil
+	}
+	p := spec.Linux.Personality
+	// Like runc, reject flags, since none are defined.
+	if len(p.Flags) != 0 {
+		return 0, fmt.Errorf("personality flags are not supported: %v", p.Flags)
+	}
+	switch p.Domain {
+	case specs.PerLinux:
+		return linux.PER_LINUX, nil
+	case specs.PerLinux32:
+		return linux.PER_LINUX32, nil
+	default:
+		return 0, fmt.Errorf("invalid personality domain %q", p.Domain)
+	}
+}
+
 // absPath turns the given path into an absolute path (if it is not already
 // absolute) by prepending the base path.
 func absPath(base, rel string) string {
@@ -185,6 +209,9 @@ func ReadSpecFromFile(bundleDir string, specFile *os.File, conf *config.Config)
 	if err := ValidateSpec(&spec); err != nil {
 		return nil, err
 	}
+	if err := addMountIDMappings(specBytes, &spec); err != nil {
+		return nil, err
+	}
 	// Turn any relative paths in the spec to absolute by prepending the bundleDir.
 	spec.Root.Path = absPath(bundleDir, spec.Root.Path)
 	for i := range spec.Mounts {
@@ -340,6 +367,29 @@ func IsGoferMount(m specs.Mount) bool {
 	return m.Type == "bind" && m.Source != ""
 }
 
+// IsHostProcSysMount returns true if the given mount is a gofer mount whose
+// source is the host's /proc or /sys, or a path under them.
+func IsHostProcSysMount(m specs.Mount) bool {
+	if !IsGoferMount(m) {
+		return false
+	}
+	src := filepath.Clean(m.Source)
+	for _, dir := range []string{"/proc", "/sys"} {
+		if src == dir || strings.HasPrefix(src, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExtImageMount returns true if the given mount is an ext2, ext3 or ext4
+// filesystem image at m.Source, which is read by the sandbox itself rather
+// than served by the gofer.
+func IsExtImageMount(m specs.Mount) bool {
+	MaybeConvertToBindMount(&m)
+	return m.Type == "ext4" && m.Source != ""
+}
+
 // MaybeConvertToBindMount converts mount type to "bind" in case any of the
 // mount options are either "bind" or "rbind" as required by the OCI spec.
 //
@@ -15,6 +15,7 @@
 package specutils
 
 import (
+	"encoding/json"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -256,6 +257,32 @@ func TestSpecInvalid(t *testing.T) {
 			},
 			error: "root mount propagation option must specify private or slave",
 		},
+		{
+			name: "valid personality",
+			spec: specs.Spec{
+				Root: &specs.Root{Path: "/"},
+				Process: &specs.Process{
+					Args: []string{"/bin/true"},
+				},
+				Linux: &specs.Linux{
+					Personality: &specs.LinuxPersonality{Domain: specs.PerLinux32},
+				},
+			},
+			error: "",
+		},
+		{
+			name: "invalid personality",
+			spec: specs.Spec{
+				Root: &specs.Root{Path: "/"},
+				Process: &specs.Process{
+					Args: []string{"/bin/true"},
+				},
+				Linux: &specs.Linux{
+					Personality: &specs.LinuxPersonality{Domain: "LINUX16"},
+				},
+			},
+			error: "invalid personality domain",
+		},
 	} {
 		err := ValidateSpec(&test.spec)
 		if len(test.error) == 0 {
@@ -269,3 +296,93 @@ func TestSpecInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestIsHostProcSysMount(t *testing.T) {
+	for _, test := range []struct {
+		mount specs.Mount
+		want  bool
+	}{
+		{mount: specs.Mount{Type: "bind", Source: "/sys/fs/cgroup"}, want: true},
+		{mount: specs.Mount{Type: "none", Source: "/proc/1/net", Options: []string{"rbind"}}, want: true},
+		{mount: specs.Mount{Type: "bind", Source: "/sys"}, want: true},
+		{mount: specs.Mount{Type: "bind", Source: "/sys/../proc/meminfo"}, want: true},
+		{mount: specs.Mount{Type: "bind", Source: "/system"}, want: false},
+		{mount: specs.Mount{Type: "bind", Source: "/tmp/proc"}, want: false},
+		{mount: specs.Mount{Type: "bind", Source: "/sys/../tmp"}, want: false},
+		{mount: specs.Mount{Type: "sysfs", Source: "/sys"}, want: false},
+		{mount: specs.Mount{Type: "proc", Source: "proc"}, want: false},
+	} {
+		if got := IsHostProcSysMount(test.mount); got != test.want {
+			t.Errorf("IsHostProcSysMount(%+v) = %t, want: %t", test.mount, got, test.want)
+		}
+	}
+}
+
+func TestMountIDMappings(t *testing.T) {
+	spec := &specs.Spec{
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/data", Type: "bind", Source: "/host/data", Options: []string{"ro"}},
+		},
+	}
+	specBytes := []byte(`{"mounts": [
+		{"destination": "/proc", "type": "proc", "source": "proc"},
+		{"destination": "/data", "type": "bind", "source": "/host/data", "options": ["ro"],
+		 "uidMappings": [{"containerID": 0, "hostID": 100000, "size": 65536}],
+		 "gidMappings": [{"containerID": 0, "hostID": 200000, "size": 100}, {"containerID": 1000, "hostID": 300000, "size": 1}]}
+	]}`)
+	if err := addMountIDMappings(specBytes, spec); err != nil {
+		t.Fatalf("addMountIDMappings() failed: %v", err)
+	}
+
+	uids, gids, err := MountIDMappings(&spec.Mounts[0])
+	if err != nil || len(uids) != 0 || len(gids) != 0 {
+		t.Errorf("MountIDMappings(%+v) = %v, %v, %v, want no mappings", spec.Mounts[0], uids, gids, err)
+	}
+	uids, gids, err = MountIDMappings(&spec.Mounts[1])
+	if err != nil {
+		t.Fatalf("MountIDMappings(%+v) failed: %v", spec.Mounts[1], err)
+	}
+	wantUIDs := []specs.LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}}
+	wantGIDs := []specs.LinuxIDMapping{{ContainerID: 0, HostID: 200000, Size: 100}, {ContainerID: 1000, HostID: 300000, Size: 1}}
+	if fmt.Sprint(uids) != fmt.Sprint(wantUIDs) || fmt.Sprint(gids) != fmt.Sprint(wantGIDs) {
+		t.Errorf("MountIDMappings(%+v) = %v, %v, want %v, %v", spec.Mounts[1], uids, gids, wantUIDs, wantGIDs)
+	}
+	if got := spec.Mounts[1].Options[0]; got != "ro" {
+		t.Errorf("first option is %q, want \"ro\"", got)
+	}
+
+	for _, test := range []struct {
+		name  string
+		mount string
+		error string
+	}{
+		{
+			name:  "not bind",
+			mount: `{"destination": "/t", "type": "tmpfs", "uidMappings": [{"containerID": 0, "hostID": 1, "size": 1}], "gidMappings": [{"containerID": 0, "hostID": 1, "size": 1}]}`,
+			error: "only supported for bind mounts",
+		},
+		{
+			name:  "missing gid mappings",
+			mount: `{"destination": "/t", "type": "bind", "source": "/t", "uidMappings": [{"containerID": 0, "hostID": 1, "size": 1}]}`,
+			error: "both uidMappings and gidMappings must be set",
+		},
+		{
+			name:  "empty mapping",
+			mount: `{"destination": "/t", "type": "bind", "source": "/t", "uidMappings": [{"containerID": 0, "hostID": 1, "size": 0}], "gidMappings": [{"containerID": 0, "hostID": 1, "size": 1}]}`,
+			error: "size 0",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			specBytes := []byte(`{"mounts": [` + test.mount + `]}`)
+			var spec specs.Spec
+			if err := json.Unmarshal(specBytes, &spec); err != nil {
+				t.Fatalf("json.Unmarshal() failed: %v", err)
+			}
+			err := addMountIDMappings(specBytes, &spec)
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("addMountIDMappings() wrong error, got: %v, want: .*%s.*", err, test.error)
+			}
+		})
+	}
+}
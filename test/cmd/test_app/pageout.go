@@ -0,0 +1,103 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	sys "syscall"
+	"time"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// madvPageout is MADV_PAGEOUT, which isn't defined by package syscall.
+const madvPageout = 21
+
+// pageout allocates memory and pages it out with madvise(MADV_PAGEOUT) when
+// asked to. Progress is reported by creating files in a directory:
+//   - "allocated" once the memory has been allocated and touched;
+//   - "done" once the memory has been paged out, after the file "pageout" is
+//     created by the caller.
+type pageout struct {
+	dir  string
+	size int
+}
+
+// Name implements subcommands.Command.
+func (*pageout) Name() string {
+	return "pageout"
+}
+
+// Synopsis implements subcommands.Command.
+func (*pageout) Synopsis() string {
+	return "allocates memory and pages it out on request"
+}
+
+// Usage implements subcommands.Command.
+func (*pageout) Usage() string {
+	return "pageout <flags>"
+}
+
+// SetFlags implements subcommands.Command.
+func (c *pageout) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.dir, "dir", "", "directory used to synchronize with the caller")
+	f.IntVar(&c.size, "size", 128<<20, "size of the allocation in bytes")
+}
+
+// Execute implements subcommands.Command.
+func (c *pageout) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if c.dir == "" {
+		log.Fatal("--dir must be set")
+	}
+	b, err := sys.Mmap(-1, 0, c.size, sys.PROT_READ|sys.PROT_WRITE, sys.MAP_PRIVATE|sys.MAP_ANONYMOUS)
+	if err != nil {
+		log.Fatalf("mmap failed: %v", err)
+	}
+	// Commit every page by writing to it, but leave it zero-filled, as for
+	// heap memory that was allocated and is no longer used.
+	pageSize := os.Getpagesize()
+	for i := 0; i < len(b); i += pageSize {
+		b[i] = 0
+	}
+	touch(filepath.Join(c.dir, "allocated"))
+
+	for {
+		if _, err := os.Stat(filepath.Join(c.dir, "pageout")); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := sys.Madvise(b, madvPageout); err != nil {
+		log.Fatalf("madvise(MADV_PAGEOUT) failed: %v", err)
+	}
+	touch(filepath.Join(c.dir, "done"))
+
+	// Keep the mapping alive until killed.
+	for {
+		time.Sleep(time.Hour)
+	}
+}
+
+func touch(path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatalf("error creating %q: %v", path, err)
+	}
+	f.Close()
+}
@@ -236,6 +236,9 @@ ALL_TESTS = [
     PacketimpactTestInfo(
         name = "tcp_user_timeout",
     ),
+    PacketimpactTestInfo(
+        name = "tcp_keepalive_user_timeout",
+    ),
     PacketimpactTestInfo(
         name = "tcp_zero_receive_window",
     ),
@@ -300,6 +303,9 @@ ALL_TESTS = [
     PacketimpactTestInfo(
         name = "tcp_info",
     ),
+    PacketimpactTestInfo(
+        name = "tcp_pacing",
+    ),
     PacketimpactTestInfo(
         name = "tcp_fin_retransmission",
     ),
@@ -0,0 +1,144 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_keepalive_user_timeout_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	testbench.Initialize(flag.CommandLine)
+}
+
+// TestKeepaliveTimeToReset measures how long it takes for an idle connection
+// whose keepalive probes go unanswered to be reset, under combinations of the
+// keepalive options and TCP_USER_TIMEOUT.
+func TestKeepaliveTimeToReset(t *testing.T) {
+	// slack is the allowed difference between the expected and the measured
+	// time to reset.
+	const slack = 500 * time.Millisecond
+
+	for _, tt := range []struct {
+		description string
+		idle        time.Duration
+		interval    time.Duration
+		count       int32
+		userTimeout time.Duration
+		// If newIdle is non-zero, TCP_KEEPIDLE is changed to it after
+		// keepalives are enabled.
+		newIdle time.Duration
+		// If newCount is non-zero, TCP_KEEPCNT is changed to it after
+		// newCountAfter probes were received.
+		newCount      int32
+		newCountAfter int
+		want          time.Duration
+	}{
+		{
+			description: "KeepCount",
+			idle:        time.Second,
+			interval:    time.Second,
+			count:       3,
+			want:        4 * time.Second,
+		},
+		{
+			// The user timeout replaces the keepalive count, so the
+			// connection survives more unanswered probes than count.
+			description: "UserTimeoutLongerThanKeepCount",
+			idle:        time.Second,
+			interval:    time.Second,
+			count:       1,
+			userTimeout: 3500 * time.Millisecond,
+			want:        4 * time.Second,
+		},
+		{
+			description: "UserTimeoutShorterThanKeepCount",
+			idle:        time.Second,
+			interval:    time.Second,
+			count:       10,
+			userTimeout: 2500 * time.Millisecond,
+			want:        3 * time.Second,
+		},
+		{
+			// The new count applies to the probes that were already sent.
+			description:   "KeepCountLoweredAfterProbes",
+			idle:          time.Second,
+			interval:      time.Second,
+			count:         10,
+			newCount:      2,
+			newCountAfter: 2,
+			want:          3 * time.Second,
+		},
+		{
+			// The new idle time applies to the established connection.
+			description: "KeepIdleLoweredAfterEnable",
+			idle:        time.Hour,
+			interval:    time.Second,
+			count:       1,
+			newIdle:     time.Second,
+			want:        2 * time.Second,
+		},
+	} {
+		t.Run(tt.description, func(t *testing.T) {
+			dut := testbench.NewDUT(t)
+			listenFD, remotePort := dut.CreateListener(t, unix.SOCK_STREAM, unix.IPPROTO_TCP, 1)
+			defer dut.Close(t, listenFD)
+			conn := dut.Net.NewTCPIPv4(t, testbench.TCP{DstPort: &remotePort}, testbench.TCP{SrcPort: &remotePort})
+			defer conn.Close(t)
+			conn.Connect(t)
+			acceptFD, _ := dut.Accept(t, listenFD)
+			defer dut.Close(t, acceptFD)
+
+			dut.SetSockOptInt(t, acceptFD, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE, int32(tt.idle.Seconds()))
+			dut.SetSockOptInt(t, acceptFD, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, int32(tt.interval.Seconds()))
+			dut.SetSockOptInt(t, acceptFD, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, tt.count)
+			if tt.userTimeout != 0 {
+				dut.SetSockOptInt(t, acceptFD, unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, int32(tt.userTimeout.Milliseconds()))
+			}
+			start := time.Now()
+			dut.SetSockOptInt(t, acceptFD, unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1)
+			if tt.newIdle != 0 {
+				dut.SetSockOptInt(t, acceptFD, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE, int32(tt.newIdle.Seconds()))
+			}
+			if tt.newCount != 0 {
+				for i := 0; i < tt.newCountAfter; i++ {
+					if _, err := conn.Expect(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagAck)}, tt.want); err != nil {
+						t.Fatalf("expected keepalive probe %d: %s", i, err)
+					}
+				}
+				dut.SetSockOptInt(t, acceptFD, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, tt.newCount)
+			}
+
+			// Don't answer any probes, and wait for the connection to be
+			// reset.
+			pfds := dut.Poll(t, []unix.PollFd{{Fd: acceptFD, Events: unix.POLLIN}}, tt.want+4*slack)
+			elapsed := time.Since(start)
+			if len(pfds) != 1 || pfds[0].Revents&(unix.POLLERR|unix.POLLHUP) == 0 {
+				t.Fatalf("connection still alive after %s, want reset after %s", elapsed, tt.want)
+			}
+			if elapsed < tt.want-slack || elapsed > tt.want+slack {
+				t.Errorf("connection reset after %s, want %s (+/- %s)", elapsed, tt.want, slack)
+			}
+			if got, want := dut.GetSockOptInt(t, acceptFD, unix.SOL_SOCKET, unix.SO_ERROR), int32(unix.ETIMEDOUT); got != want {
+				t.Errorf("got SO_ERROR = %d, want = %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_pacing_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/test/packetimpact/testbench"
+)
+
+func init() {
+	testbench.Initialize(flag.CommandLine)
+}
+
+const (
+	// payloadSize is the size used to send packets.
+	payloadSize = header.TCPDefaultMSS
+
+	// pacingRate is the SO_MAX_PACING_RATE used by the DUT, in bytes per
+	// second.
+	pacingRate = 50 * payloadSize
+
+	// numUnpacedPkts is the number of data packets sent before the DUT
+	// starts pacing.
+	numUnpacedPkts = 10
+)
+
+// TestTCPPacing tests that SO_MAX_PACING_RATE spaces out the packets sent by
+// the DUT.
+func TestTCPPacing(t *testing.T) {
+	dut := testbench.NewDUT(t)
+	listenFD, remotePort := dut.CreateListener(t, unix.SOCK_STREAM, unix.IPPROTO_TCP, 1)
+	defer dut.Close(t, listenFD)
+
+	conn := dut.Net.NewTCPIPv4(t, testbench.TCP{DstPort: &remotePort}, testbench.TCP{SrcPort: &remotePort})
+	defer conn.Close(t)
+	conn.Connect(t)
+
+	acceptFD, _ := dut.Accept(t, listenFD)
+	defer dut.Close(t, acceptFD)
+
+	dut.SetSockOptInt(t, acceptFD, unix.SOL_SOCKET, unix.SO_MAX_PACING_RATE, pacingRate)
+
+	// Neither Linux nor netstack pace the first few data packets.
+	sn := *conn.RemoteSeqNum(t)
+	payload := make([]byte, payloadSize)
+	for i := 0; i < numUnpacedPkts; i++ {
+		dut.Send(t, acceptFD, payload, 0)
+		if _, err := conn.Expect(t, testbench.TCP{SeqNum: testbench.Uint32(uint32(sn))}, time.Second); err != nil {
+			t.Fatalf("expected packet #%d: %s", i+1, err)
+		}
+		sn.UpdateForward(seqnum.Size(payloadSize))
+		conn.Send(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagAck), AckNum: testbench.Uint32(uint32(sn))})
+	}
+
+	// Send a burst that fits in the congestion window, and check that it
+	// takes at least half of the time the pacing rate allows for. The margin
+	// accounts for Linux sending up to two packets at once at low rates
+	// (see net.ipv4.tcp_min_tso_segs).
+	const numPkts = 10
+	dut.Send(t, acceptFD, make([]byte, numPkts*payloadSize), 0)
+	var first time.Time
+	for i := 0; i < numPkts; i++ {
+		if _, err := conn.Expect(t, testbench.TCP{SeqNum: testbench.Uint32(uint32(sn))}, time.Second); err != nil {
+			t.Fatalf("expected paced packet #%d: %s", i+1, err)
+		}
+		if i == 0 {
+			first = time.Now()
+		}
+		sn.UpdateForward(seqnum.Size(payloadSize))
+	}
+	gap := time.Duration(payloadSize) * time.Second / pacingRate
+	if got, want := time.Since(first), numPkts/2*gap; got < want {
+		t.Errorf("got %d packets in %s, want at least %s at %d bytes/s", numPkts, got, want, pacingRate)
+	}
+	conn.Send(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagAck), AckNum: testbench.Uint32(uint32(sn))})
+}
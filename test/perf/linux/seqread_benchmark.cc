@@ -0,0 +1,120 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <fcntl.h>
+#include <stdlib.h>
+#include <sys/uio.h>
+#include <unistd.h>
+
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "benchmark/benchmark.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/logging.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// Create a 2GB file that will be read sequentially, which is larger than the
+// amount of data read ahead.
+const uint64_t kFileSize = 2ULL << 30;
+
+// How many bytes to write at once to initialize the file used to read from.
+const uint32_t kWriteSize = 65536;
+
+TempPath CreateFile(uint64_t file_size) {
+  auto path = TempPath::CreateFile().ValueOrDie();
+  FileDescriptor fd = Open(path.path(), O_WRONLY).ValueOrDie();
+
+  // Try to minimize syscalls by using maximum size writev() requests.
+  std::vector<char> buffer(kWriteSize);
+  RandomizeBuffer(buffer.data(), buffer.size());
+  const std::vector<std::vector<struct iovec>> iovecs_list =
+      GenerateIovecs(file_size, buffer.data(), buffer.size());
+  for (const auto& iovecs : iovecs_list) {
+    TEST_CHECK(writev(fd.get(), iovecs.data(), iovecs.size()) >= 0);
+  }
+
+  return path;
+}
+
+// Global test state, initialized once per process lifetime.
+struct GlobalState {
+  const TempPath tmpfile;
+  explicit GlobalState(TempPath tfile) : tmpfile(std::move(tfile)) {}
+};
+
+GlobalState& GetGlobalState() {
+  // This gets created only once throughout the lifetime of the process.
+  // Use a dynamically allocated object (that is never deleted) to avoid order
+  // of destruction of static storage variables issues.
+  static GlobalState* const state = new GlobalState(CreateFile(kFileSize));
+  return *state;
+}
+
+// DropCache asks for the file's cached data to be dropped, so that it is read
+// from the filesystem again.
+void DropCache(int fd) {
+  TEST_PCHECK(posix_fadvise(fd, 0, 0, POSIX_FADV_DONTNEED) == 0);
+}
+
+// BM_SeqRead reads the file sequentially, starting over from the beginning
+// with an empty cache at EOF. The second argument is the advice given for the
+// file: POSIX_FADV_RANDOM disables readahead, for comparison.
+void BM_SeqRead(benchmark::State& state) {
+  const int size = state.range(0);
+  const int advice = state.range(1);
+
+  GlobalState& global_state = GetGlobalState();
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(global_state.tmpfile.path(), O_RDONLY));
+  TEST_PCHECK(posix_fadvise(fd.get(), 0, 0, advice) == 0);
+  DropCache(fd.get());
+  std::vector<char> buf(size);
+
+  uint64_t offset = 0;
+  for (auto _ : state) {
+    if (offset + size > kFileSize) {
+      state.PauseTiming();
+      DropCache(fd.get());
+      offset = 0;
+      state.ResumeTiming();
+    }
+    TEST_CHECK(PreadFd(fd.get(), buf.data(), buf.size(), offset) == size);
+    offset += size;
+  }
+
+  state.SetBytesProcessed(static_cast<int64_t>(size) *
+                          static_cast<int64_t>(state.iterations()));
+}
+
+void Args(benchmark::internal::Benchmark* benchmark) {
+  for (int advice : {POSIX_FADV_NORMAL, POSIX_FADV_RANDOM}) {
+    for (int size = 4 << 10; size <= 1 << 20; size *= 4) {
+      benchmark->Args({size, advice});
+    }
+  }
+}
+
+BENCHMARK(BM_SeqRead)->Apply(&Args)->UseRealTime();
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -71,6 +71,7 @@ def _syscall_test(
         add_host_communication = False,
         lisafs = True,
         fuse = False,
+        rseq = False,
         container = None,
         one_sandbox = True,
         **kwargs):
@@ -141,6 +142,7 @@ def _syscall_test(
         "--add-host-communication=" + str(add_host_communication),
         "--lisafs=" + str(lisafs),
         "--fuse=" + str(fuse),
+        "--rseq=" + str(rseq),
         "--strace=" + str(debug),
         "--debug=" + str(debug),
         "--container=" + str(container),
@@ -174,6 +176,7 @@ def syscall_test(
         add_hostinet = False,
         one_sandbox = True,
         fuse = False,
+        rseq = False,
         allow_native = True,
         debug = True,
         container = None,
@@ -189,6 +192,7 @@ def syscall_test(
       add_hostinet: add a hostinet test.
       one_sandbox: runs each unit test in a new sandbox instance.
       fuse: enable FUSE support.
+      rseq: enable restartable sequences.
       allow_native: generate a native test variant.
       debug: enable debug output.
       container: Run the test in a container. If None, determined from other information.
@@ -220,6 +224,7 @@ def syscall_test(
             add_host_communication = add_host_communication,
             tags = platform_tags + tags,
             fuse = fuse,
+            rseq = rseq,
             debug = debug,
             container = container,
             one_sandbox = one_sandbox,
@@ -235,6 +240,7 @@ def syscall_test(
         tags = platforms[default_platform] + tags,
         debug = debug,
         fuse = fuse,
+        rseq = rseq,
         container = container,
         one_sandbox = one_sandbox,
         lisafs = False,
@@ -249,6 +255,7 @@ def syscall_test(
             tags = platforms.get(default_platform, []) + tags,
             debug = debug,
             fuse = fuse,
+            rseq = rseq,
             container = container,
             one_sandbox = one_sandbox,
             overlay = True,
@@ -264,6 +271,7 @@ def syscall_test(
             tags = platforms.get(default_platform, []) + tags,
             debug = debug,
             fuse = fuse,
+            rseq = rseq,
             container = container,
             one_sandbox = one_sandbox,
             **kwargs
@@ -281,5 +289,6 @@ def syscall_test(
             one_sandbox = one_sandbox,
             file_access = "shared",
             fuse = fuse,
+            rseq = rseq,
             **kwargs
         )
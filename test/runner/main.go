@@ -52,6 +52,7 @@ var (
 	fileAccess         = flag.String("file-access", "exclusive", "mounts root in exclusive or shared mode")
 	overlay            = flag.Bool("overlay", false, "wrap filesystem mounts with writable tmpfs overlay")
 	fuse               = flag.Bool("fuse", false, "enable FUSE")
+	rseq               = flag.Bool("rseq", false, "enable restartable sequences")
 	lisafs             = flag.Bool("lisafs", true, "enable lisafs protocol if vfs2 is also enabled")
 	container          = flag.Bool("container", false, "run tests in their own namespaces (user ns, network ns, etc), pretending to be root. Implicitly enabled if network=host, or if using network namespaces")
 	setupContainerPath = flag.String("setup-container", "", "path to setup_container binary (for use with --container)")
@@ -211,6 +212,9 @@ func runRunsc(tc *gtest.TestCase, spec *specs.Spec) error {
 	if *fuse {
 		args = append(args, "-fuse")
 	}
+	if *rseq {
+		args = append(args, "-rseq")
+	}
 	if *debug {
 		args = append(args, "-debug", "-log-packets=true")
 	}
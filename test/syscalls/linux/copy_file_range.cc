@@ -0,0 +1,212 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+#include <fcntl.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr char kContents[] = "0123456789abcdefghijklmnopqrstuvwxyz";
+constexpr int kContentsLen = sizeof(kContents) - 1;
+
+int copy_file_range(int fd_in, off_t* off_in, int fd_out, off_t* off_out,
+                    size_t len, unsigned int flags) {
+  return syscall(__NR_copy_file_range, fd_in, off_in, fd_out, off_out, len,
+                 flags);
+}
+
+class CopyFileRangeTest : public ::testing::Test {
+ protected:
+  void SetUp() override {
+    in_file_ = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+        GetAbsoluteTestTmpdir(), kContents, TempPath::kDefaultFileMode));
+    out_file_ = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+    in_fd_ = ASSERT_NO_ERRNO_AND_VALUE(Open(in_file_.path(), O_RDONLY));
+    out_fd_ = ASSERT_NO_ERRNO_AND_VALUE(Open(out_file_.path(), O_RDWR));
+  }
+
+  TempPath in_file_;
+  TempPath out_file_;
+  FileDescriptor in_fd_;
+  FileDescriptor out_fd_;
+};
+
+TEST_F(CopyFileRangeTest, CopyAll) {
+  EXPECT_THAT(copy_file_range(in_fd_.get(), nullptr, out_fd_.get(), nullptr,
+                              kContentsLen, 0),
+              SyscallSucceedsWithValue(kContentsLen));
+
+  // Both file offsets are advanced.
+  EXPECT_THAT(lseek(in_fd_.get(), 0, SEEK_CUR),
+              SyscallSucceedsWithValue(kContentsLen));
+  EXPECT_THAT(lseek(out_fd_.get(), 0, SEEK_CUR),
+              SyscallSucceedsWithValue(kContentsLen));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(out_file_.path())),
+            kContents);
+}
+
+TEST_F(CopyFileRangeTest, LengthClampedAtEOF) {
+  off_t in_off = kContentsLen - 4;
+  EXPECT_THAT(copy_file_range(in_fd_.get(), &in_off, out_fd_.get(), nullptr,
+                              1024, 0),
+              SyscallSucceedsWithValue(4));
+  EXPECT_EQ(in_off, kContentsLen);
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(out_file_.path())),
+            std::string(kContents + kContentsLen - 4));
+
+  // Copying from EOF copies nothing.
+  EXPECT_THAT(copy_file_range(in_fd_.get(), &in_off, out_fd_.get(), nullptr,
+                              1024, 0),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(in_off, kContentsLen);
+}
+
+TEST_F(CopyFileRangeTest, ExplicitOffsets) {
+  off_t in_off = 10;
+  off_t out_off = 3;
+  EXPECT_THAT(
+      copy_file_range(in_fd_.get(), &in_off, out_fd_.get(), &out_off, 5, 0),
+      SyscallSucceedsWithValue(5));
+  EXPECT_EQ(in_off, 15);
+  EXPECT_EQ(out_off, 8);
+
+  // File offsets are not changed when offsets are passed explicitly.
+  EXPECT_THAT(lseek(in_fd_.get(), 0, SEEK_CUR), SyscallSucceedsWithValue(0));
+  EXPECT_THAT(lseek(out_fd_.get(), 0, SEEK_CUR), SyscallSucceedsWithValue(0));
+
+  // The gap before out_off reads as zeroes.
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(out_file_.path())),
+            std::string(3, '\0') + "abcde");
+}
+
+TEST_F(CopyFileRangeTest, OverwriteWithinSameFile) {
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(in_file_.path(), O_RDWR));
+  off_t in_off = 0;
+  off_t out_off = kContentsLen - 10;
+  EXPECT_THAT(copy_file_range(fd.get(), &in_off, fd.get(), &out_off, 10, 0),
+              SyscallSucceedsWithValue(10));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(in_file_.path())),
+            "0123456789abcdefghijklmnop0123456789");
+}
+
+TEST_F(CopyFileRangeTest, OverlappingRangesInSameFile) {
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(in_file_.path(), O_RDWR));
+  off_t in_off = 0;
+  off_t out_off = 5;
+  EXPECT_THAT(copy_file_range(fd.get(), &in_off, fd.get(), &out_off, 10, 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_F(CopyFileRangeTest, CopyBetweenFilesystems) {
+  // memfds are backed by the sentry's tmpfs, while the test's temporary
+  // files may be backed by a gofer.
+  const FileDescriptor memfd(syscall(__NR_memfd_create, "test", 0));
+  ASSERT_THAT(memfd.get(), SyscallSucceeds());
+
+  EXPECT_THAT(copy_file_range(in_fd_.get(), nullptr, memfd.get(), nullptr,
+                              kContentsLen, 0),
+              SyscallSucceedsWithValue(kContentsLen));
+  EXPECT_THAT(lseek(memfd.get(), 0, SEEK_SET), SyscallSucceeds());
+  EXPECT_THAT(copy_file_range(memfd.get(), nullptr, out_fd_.get(), nullptr,
+                              kContentsLen, 0),
+              SyscallSucceedsWithValue(kContentsLen));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(out_file_.path())),
+            kContents);
+}
+
+TEST_F(CopyFileRangeTest, SeesUnflushedWrites) {
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(in_file_.path(), O_RDWR));
+  ASSERT_THAT(pwrite(fd.get(), "ABC", 3, 0), SyscallSucceedsWithValue(3));
+
+  EXPECT_THAT(copy_file_range(fd.get(), nullptr, out_fd_.get(), nullptr, 5, 0),
+              SyscallSucceedsWithValue(5));
+
+  // The copy is visible through the destination's page cache.
+  char buf[5];
+  EXPECT_THAT(pread(out_fd_.get(), buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_EQ(std::string(buf, sizeof(buf)), "ABC34");
+}
+
+TEST_F(CopyFileRangeTest, InvalidFlags) {
+  EXPECT_THAT(
+      copy_file_range(in_fd_.get(), nullptr, out_fd_.get(), nullptr, 1, 1),
+      SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_F(CopyFileRangeTest, NegativeOffset) {
+  off_t in_off = -1;
+  EXPECT_THAT(
+      copy_file_range(in_fd_.get(), &in_off, out_fd_.get(), nullptr, 1, 0),
+      SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_F(CopyFileRangeTest, BadFileModes) {
+  // The input file must be readable.
+  const FileDescriptor wronly =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(out_file_.path(), O_WRONLY));
+  EXPECT_THAT(
+      copy_file_range(wronly.get(), nullptr, out_fd_.get(), nullptr, 1, 0),
+      SyscallFailsWithErrno(EBADF));
+
+  // The output file must be writable.
+  EXPECT_THAT(
+      copy_file_range(in_fd_.get(), nullptr, in_fd_.get(), nullptr, 1, 0),
+      SyscallFailsWithErrno(EBADF));
+
+  // The output file must not be opened with O_APPEND.
+  const FileDescriptor append =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(out_file_.path(), O_WRONLY | O_APPEND));
+  EXPECT_THAT(
+      copy_file_range(in_fd_.get(), nullptr, append.get(), nullptr, 1, 0),
+      SyscallFailsWithErrno(EBADF));
+}
+
+TEST_F(CopyFileRangeTest, Directory) {
+  const FileDescriptor dir =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(GetAbsoluteTestTmpdir(), O_RDONLY));
+  EXPECT_THAT(copy_file_range(dir.get(), nullptr, out_fd_.get(), nullptr, 1, 0),
+              SyscallFailsWithErrno(EISDIR));
+}
+
+TEST_F(CopyFileRangeTest, NotRegularFile) {
+  int pipe_fds[2];
+  ASSERT_THAT(pipe(pipe_fds), SyscallSucceeds());
+  const FileDescriptor rfd(pipe_fds[0]);
+  const FileDescriptor wfd(pipe_fds[1]);
+  EXPECT_THAT(
+      copy_file_range(in_fd_.get(), nullptr, wfd.get(), nullptr, 1, 0),
+      SyscallFailsWithErrno(EINVAL));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -13,6 +13,8 @@
 // limitations under the License.
 
 #include <fcntl.h>
+#include <linux/random.h>
+#include <sys/ioctl.h>
 #include <sys/stat.h>
 #include <sys/types.h>
 #include <unistd.h>
@@ -21,6 +23,7 @@
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "test/util/capability_util.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/test_util.h"
 
@@ -174,6 +177,61 @@ TEST(DevTest, ReadDevFuseWithoutMount) {
               SyscallFailsWithErrno(EPERM));
 }
 
+TEST(DevTest, RandomGetEntropyCount) {
+  for (const char* path : {"/dev/random", "/dev/urandom"}) {
+    const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path, O_RDONLY));
+    int cnt = -1;
+    ASSERT_THAT(ioctl(fd.get(), RNDGETENTCNT, &cnt), SyscallSucceeds());
+    EXPECT_GE(cnt, 0);
+    if (IsRunningOnGvisor()) {
+      EXPECT_EQ(cnt, 256);
+    }
+  }
+}
+
+TEST(DevTest, RandomAddEntropy) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/random", O_WRONLY));
+  int credit = 8;
+  EXPECT_THAT(ioctl(fd.get(), RNDADDTOENTCNT, &credit), SyscallSucceeds());
+  credit = -1;
+  EXPECT_THAT(ioctl(fd.get(), RNDADDTOENTCNT, &credit),
+              SyscallFailsWithErrno(EINVAL));
+
+  struct {
+    struct rand_pool_info info;
+    char buf[16];
+  } pool = {};
+  pool.info.entropy_count = 8;
+  pool.info.buf_size = sizeof(pool.buf);
+  EXPECT_THAT(ioctl(fd.get(), RNDADDENTROPY, &pool), SyscallSucceeds());
+  pool.info.entropy_count = -1;
+  EXPECT_THAT(ioctl(fd.get(), RNDADDENTROPY, &pool),
+              SyscallFailsWithErrno(EINVAL));
+
+  int cnt = -1;
+  ASSERT_THAT(ioctl(fd.get(), RNDGETENTCNT, &cnt), SyscallSucceeds());
+  EXPECT_GE(cnt, 0);
+  EXPECT_LE(cnt, 256);
+}
+
+TEST(DevTest, RandomAddEntropyWithoutCapability) {
+  AutoCapability cap(CAP_SYS_ADMIN, false);
+
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/random", O_WRONLY));
+  int credit = 8;
+  EXPECT_THAT(ioctl(fd.get(), RNDADDTOENTCNT, &credit),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(ioctl(fd.get(), RNDZAPENTCNT), SyscallFailsWithErrno(EPERM));
+
+  // Anyone can still read the entropy count.
+  int cnt = -1;
+  EXPECT_THAT(ioctl(fd.get(), RNDGETENTCNT, &cnt), SyscallSucceeds());
+}
+
 }  // namespace
 }  // namespace testing
 
@@ -14,6 +14,7 @@
 
 #include <errno.h>
 #include <limits.h>
+#include <netinet/in.h>
 #include <pthread.h>
 #include <signal.h>
 #include <stdint.h>
@@ -22,11 +23,18 @@
 #include <sys/epoll.h>
 #include <sys/eventfd.h>
 #include <sys/signalfd.h>
+#include <sys/socket.h>
 #include <time.h>
 #include <unistd.h>
 
+#include <atomic>
+#include <memory>
+#include <vector>
+
 #include "gtest/gtest.h"
 #include "absl/synchronization/mutex.h"
+#include "absl/time/clock.h"
+#include "absl/time/time.h"
 #include "test/util/epoll_util.h"
 #include "test/util/eventfd_util.h"
 #include "test/util/file_descriptor.h"
@@ -690,6 +698,238 @@ TEST(EpollTest, ReadyMutexCircularity) {
   read(sigfd.get(), &info, sizeof(info));
 }
 
+TEST(EpollTest, EpollPwait2InvalidTimeout) {
+  auto epollfd = ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD());
+  struct epoll_event result[kFDsPerEpoll];
+  struct timespec timeout = {};
+  SKIP_IF(!IsRunningOnGvisor() &&
+          epoll_pwait2(epollfd.get(), result, kFDsPerEpoll, &timeout, nullptr) <
+              0 &&
+          errno == ENOSYS);
+
+  timeout.tv_nsec = 1000000000;
+  EXPECT_THAT(
+      epoll_pwait2(epollfd.get(), result, kFDsPerEpoll, &timeout, nullptr),
+      SyscallFailsWithErrno(EINVAL));
+  timeout.tv_sec = -1;
+  timeout.tv_nsec = 0;
+  EXPECT_THAT(
+      epoll_pwait2(epollfd.get(), result, kFDsPerEpoll, &timeout, nullptr),
+      SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(EpollTest, EpollPwait2NanosecondTimeout) {
+  auto epollfd = ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD());
+  auto efd = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD());
+  ASSERT_NO_ERRNO(
+      RegisterEpollFD(epollfd.get(), efd.get(), EPOLLIN, kMagicConstant));
+  struct epoll_event result[kFDsPerEpoll];
+  struct timespec timeout = {};
+  SKIP_IF(!IsRunningOnGvisor() &&
+          epoll_pwait2(epollfd.get(), result, kFDsPerEpoll, &timeout, nullptr) <
+              0 &&
+          errno == ENOSYS);
+
+  // A timeout shorter than a millisecond must not be rounded down to zero or
+  // up to a millisecond.
+  constexpr int kTimeoutNs = 100000;
+  timeout.tv_nsec = kTimeoutNs;
+  struct timespec begin;
+  struct timespec end;
+  {
+    const DisableSave ds;  // Timing-related.
+    EXPECT_THAT(clock_gettime(CLOCK_MONOTONIC, &begin), SyscallSucceeds());
+    ASSERT_THAT(RetryEINTR(epoll_pwait2)(epollfd.get(), result, kFDsPerEpoll,
+                                         &timeout, nullptr),
+                SyscallSucceedsWithValue(0));
+    EXPECT_THAT(clock_gettime(CLOCK_MONOTONIC, &end), SyscallSucceeds());
+  }
+  EXPECT_GT(ns_elapsed(begin, end), kTimeoutNs - 1);
+}
+
+TEST(EpollTest, ExclusiveInvalidArguments) {
+  auto epollfd = ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD());
+  auto efd = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD());
+  struct epoll_event event = {};
+  event.data.u64 = kMagicConstant;
+
+  // EPOLLONESHOT can't be combined with EPOLLEXCLUSIVE.
+  event.events = EPOLLIN | EPOLLEXCLUSIVE | EPOLLONESHOT;
+  EXPECT_THAT(epoll_ctl(epollfd.get(), EPOLL_CTL_ADD, efd.get(), &event),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Epoll instances can't be registered exclusively.
+  auto epollfd2 = ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD());
+  event.events = EPOLLIN | EPOLLEXCLUSIVE;
+  EXPECT_THAT(epoll_ctl(epollfd.get(), EPOLL_CTL_ADD, epollfd2.get(), &event),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Exclusive registrations can't be modified.
+  ASSERT_THAT(epoll_ctl(epollfd.get(), EPOLL_CTL_ADD, efd.get(), &event),
+              SyscallSucceeds());
+  event.events = EPOLLIN;
+  EXPECT_THAT(epoll_ctl(epollfd.get(), EPOLL_CTL_MOD, efd.get(), &event),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Nor can registrations be made exclusive.
+  auto efd2 = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD());
+  ASSERT_THAT(epoll_ctl(epollfd.get(), EPOLL_CTL_ADD, efd2.get(), &event),
+              SyscallSucceeds());
+  event.events = EPOLLIN | EPOLLEXCLUSIVE;
+  EXPECT_THAT(epoll_ctl(epollfd.get(), EPOLL_CTL_MOD, efd2.get(), &event),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// Many threads waiting on their own epoll instance for connections on one
+// listening socket, registered with EPOLLEXCLUSIVE, should only be woken one at
+// a time.
+TEST(EpollTest, ExclusiveWakesOne) {
+  constexpr int kThreads = 16;
+  constexpr int kConnections = 10;
+  constexpr uint64_t kListener = 1;
+  constexpr uint64_t kStop = 2;
+
+  auto listener = ASSERT_NO_ERRNO_AND_VALUE(
+      Socket(AF_INET, SOCK_STREAM | SOCK_NONBLOCK, 0));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  ASSERT_THAT(
+      bind(listener.get(), reinterpret_cast<sockaddr*>(&addr), sizeof(addr)),
+      SyscallSucceeds());
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(getsockname(listener.get(), reinterpret_cast<sockaddr*>(&addr),
+                          &addrlen),
+              SyscallSucceeds());
+  ASSERT_THAT(listen(listener.get(), kConnections), SyscallSucceeds());
+  auto stop = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD());
+
+  std::vector<FileDescriptor> epollfds;
+  for (int i = 0; i < kThreads; i++) {
+    epollfds.push_back(ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD()));
+    ASSERT_NO_ERRNO(RegisterEpollFD(epollfds[i].get(), listener.get(),
+                                    EPOLLIN | EPOLLEXCLUSIVE, kListener));
+    ASSERT_NO_ERRNO(
+        RegisterEpollFD(epollfds[i].get(), stop.get(), EPOLLIN, kStop));
+  }
+
+  const DisableSave ds;  // Timing-related.
+  std::atomic<int> wakeups(0);
+  std::atomic<int> accepted(0);
+  std::vector<std::unique_ptr<ScopedThread>> threads;
+  for (int i = 0; i < kThreads; i++) {
+    int epfd = epollfds[i].get();
+    threads.emplace_back(std::make_unique<ScopedThread>([&, epfd] {
+      while (true) {
+        struct epoll_event events[2];
+        int n = RetryEINTR(epoll_wait)(epfd, events, 2, -1);
+        ASSERT_THAT(n, SyscallSucceeds());
+        bool done = false;
+        for (int j = 0; j < n; j++) {
+          if (events[j].data.u64 == kStop) {
+            done = true;
+            continue;
+          }
+          wakeups++;
+          int fd;
+          while ((fd = accept4(listener.get(), nullptr, nullptr, 0)) >= 0) {
+            close(fd);
+            accepted++;
+          }
+        }
+        if (done) {
+          return;
+        }
+      }
+    }));
+  }
+  // Give all threads time to block in epoll_wait().
+  absl::SleepFor(absl::Milliseconds(500));
+
+  std::vector<FileDescriptor> clients;
+  for (int i = 0; i < kConnections; i++) {
+    clients.push_back(
+        ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, 0)));
+    ASSERT_THAT(connect(clients[i].get(), reinterpret_cast<sockaddr*>(&addr),
+                        addrlen),
+                SyscallSucceeds());
+    absl::SleepFor(absl::Milliseconds(50));
+  }
+
+  uint64_t val = 1;
+  ASSERT_THAT(WriteFd(stop.get(), &val, sizeof(val)),
+              SyscallSucceedsWithValue(sizeof(val)));
+  for (auto& t : threads) {
+    t->Join();
+  }
+  int fd;
+  while ((fd = accept4(listener.get(), nullptr, nullptr, 0)) >= 0) {
+    close(fd);
+    accepted++;
+  }
+  EXPECT_EQ(accepted, kConnections);
+  // Without EPOLLEXCLUSIVE, every connection would wake every thread.
+  EXPECT_LE(wakeups, kConnections);
+}
+
+// EPOLL_CTL_MOD rearming an EPOLLONESHOT registration from another thread
+// while its event is being delivered must not lose the event.
+TEST(EpollTest, OneshotRearmFromOtherThread) {
+  constexpr int kIterations = 1000;
+  auto epollfd = ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD());
+  auto efd = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD());
+  ASSERT_NO_ERRNO(RegisterEpollFD(epollfd.get(), efd.get(),
+                                  EPOLLIN | EPOLLONESHOT, kMagicConstant));
+  // The eventfd stays readable, so every rearm makes it ready again.
+  uint64_t val = 1;
+  ASSERT_THAT(WriteFd(efd.get(), &val, sizeof(val)),
+              SyscallSucceedsWithValue(sizeof(val)));
+
+  std::atomic<int> delivered(0);
+  ScopedThread rearmer([&] {
+    for (int i = 1; i < kIterations; i++) {
+      while (delivered.load() < i) {
+        sched_yield();
+      }
+      struct epoll_event event = {};
+      event.events = EPOLLIN | EPOLLONESHOT;
+      event.data.u64 = kMagicConstant;
+      ASSERT_THAT(epoll_ctl(epollfd.get(), EPOLL_CTL_MOD, efd.get(), &event),
+                  SyscallSucceeds());
+    }
+  });
+  for (int i = 0; i < kIterations; i++) {
+    struct epoll_event result;
+    ASSERT_THAT(RetryEINTR(epoll_wait)(epollfd.get(), &result, 1, 5000),
+                SyscallSucceedsWithValue(1));
+    EXPECT_EQ(result.data.u64, kMagicConstant);
+    delivered++;
+  }
+  rearmer.Join();
+}
+
+// An EPOLLONESHOT event that can't be copied out remains pending.
+TEST(EpollTest, OneshotNotLostOnFault) {
+  auto epollfd = ASSERT_NO_ERRNO_AND_VALUE(NewEpollFD());
+  auto efd = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD());
+  ASSERT_NO_ERRNO(RegisterEpollFD(epollfd.get(), efd.get(),
+                                  EPOLLIN | EPOLLONESHOT, kMagicConstant));
+  uint64_t val = 1;
+  ASSERT_THAT(WriteFd(efd.get(), &val, sizeof(val)),
+              SyscallSucceedsWithValue(sizeof(val)));
+
+  EXPECT_THAT(epoll_wait(epollfd.get(),
+                         reinterpret_cast<struct epoll_event*>(-1), 1, 0),
+              SyscallFailsWithErrno(EFAULT));
+  struct epoll_event result;
+  ASSERT_THAT(epoll_wait(epollfd.get(), &result, 1, 0),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(result.data.u64, kMagicConstant);
+  // Now that it has been delivered, it's disabled until rearmed.
+  EXPECT_THAT(epoll_wait(epollfd.get(), &result, 1, 0),
+              SyscallSucceedsWithValue(0));
+}
+
 }  // namespace
 
 }  // namespace testing
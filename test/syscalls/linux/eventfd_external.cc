@@ -0,0 +1,130 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <fcntl.h>
+#include <poll.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/eventfd.h>
+#include <sys/socket.h>
+#include <sys/un.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/unix_domain_socket_test_util.h"
+#include "test/util/eventfd_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+// This file contains tests for eventfds passed to and from a host process over
+// a host UDS managed outside the sandbox / test.
+//
+// The "stream/eventfd" socket in $TEST_UDS_TREE and $TEST_UDS_ATTACH_TREE
+// sends a host EFD_SEMAPHORE eventfd and writes 3 to it once it receives a
+// byte. It then receives an eventfd, reads it once it is readable, sends back
+// the value read and writes the value plus one to it.
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr int kPollTimeoutMs = 10000;
+
+// Parameter is UDS root dir.
+using HostEventfdTest = ::testing::TestWithParam<std::string>;
+
+TEST_P(HostEventfdTest, BothDirections) {
+  const std::string env = GetParam();
+
+  const char* val = getenv(env.c_str());
+  ASSERT_NE(val, nullptr);
+  const std::string root(val);
+
+  FileDescriptor sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+
+  const std::string socket_path = JoinPath(root, "stream", "eventfd");
+  struct sockaddr_un addr = {};
+  addr.sun_family = AF_UNIX;
+  memcpy(addr.sun_path, socket_path.c_str(), socket_path.length());
+  ASSERT_THAT(connect(sock.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                      sizeof(addr)),
+              SyscallSucceeds());
+
+  // Receive the host eventfd.
+  char c = 0;
+  int fd = -1;
+  ASSERT_NO_FATAL_FAILURE(RecvSingleFD(sock.get(), &fd, &c, sizeof(c)));
+  FileDescriptor host_efd(fd);
+
+  // Ask the host to write to it, and wait for the wakeup.
+  ASSERT_THAT(WriteFd(sock.get(), &c, sizeof(c)),
+              SyscallSucceedsWithValue(sizeof(c)));
+  struct pollfd pfd = {host_efd.get(), POLLIN, 0};
+  ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, kPollTimeoutMs),
+              SyscallSucceedsWithValue(1));
+  EXPECT_TRUE(pfd.revents & POLLIN);
+
+  // The host eventfd is in semaphore mode.
+  for (int i = 0; i < 3; i++) {
+    uint64_t v = 0;
+    ASSERT_THAT(ReadFd(host_efd.get(), &v, sizeof(v)),
+                SyscallSucceedsWithValue(sizeof(v)));
+    EXPECT_EQ(v, 1);
+  }
+  ASSERT_THAT(fcntl(host_efd.get(), F_SETFL, O_NONBLOCK), SyscallSucceeds());
+  uint64_t v = 0;
+  EXPECT_THAT(ReadFd(host_efd.get(), &v, sizeof(v)),
+              SyscallFailsWithErrno(EAGAIN));
+
+  // Pass an eventfd created in the sandbox to the host and signal it.
+  FileDescriptor efd = ASSERT_NO_ERRNO_AND_VALUE(NewEventFD(0, EFD_NONBLOCK));
+  ASSERT_NO_FATAL_FAILURE(SendSingleFD(sock.get(), efd.get(), &c, sizeof(c)));
+  v = 5;
+  ASSERT_THAT(WriteFd(efd.get(), &v, sizeof(v)),
+              SyscallSucceedsWithValue(sizeof(v)));
+
+  // The host reads the value, consuming it.
+  uint64_t got = 0;
+  ASSERT_THAT(ReadFd(sock.get(), &got, sizeof(got)),
+              SyscallSucceedsWithValue(sizeof(got)));
+  EXPECT_EQ(got, 5);
+
+  // Wait for the host to write to the sandbox eventfd.
+  pfd = {efd.get(), POLLIN, 0};
+  ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, kPollTimeoutMs),
+              SyscallSucceedsWithValue(1));
+  ASSERT_THAT(ReadFd(efd.get(), &got, sizeof(got)),
+              SyscallSucceedsWithValue(sizeof(got)));
+  EXPECT_EQ(got, 6);
+  EXPECT_THAT(ReadFd(efd.get(), &got, sizeof(got)),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+INSTANTIATE_TEST_SUITE_P(Paths, HostEventfdTest,
+                         // Test access via standard path and attach point.
+                         ::testing::Values("TEST_UDS_TREE",
+                                           "TEST_UDS_ATTACH_TREE"));
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -13,11 +13,16 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <fcntl.h>
 #include <syscall.h>
 #include <unistd.h>
 
+#include <string>
+#include <vector>
+
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
@@ -30,7 +35,8 @@ TEST(FAdvise64Test, Basic) {
   auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
   const auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
 
-  // fadvise64 is noop in gVisor, so just test that it succeeds.
+  // Advice has no observable effect other than on performance, so just test
+  // that it succeeds.
   ASSERT_THAT(syscall(__NR_fadvise64, fd.get(), 0, 10, POSIX_FADV_NORMAL),
               SyscallSucceeds());
   ASSERT_THAT(syscall(__NR_fadvise64, fd.get(), 0, 10, POSIX_FADV_RANDOM),
@@ -45,6 +51,96 @@ TEST(FAdvise64Test, Basic) {
               SyscallSucceeds());
 }
 
+// Size of files read sequentially, large enough to be read ahead.
+constexpr size_t kSequentialFileSize = 4 << 20;
+
+std::string RandomContents(size_t size) {
+  std::string contents(size, '\0');
+  RandomizeBuffer(contents.data(), contents.size());
+  return contents;
+}
+
+// ReadSequentially reads the file referred to by fd from its current offset
+// to EOF in small chunks.
+std::string ReadSequentially(int fd) {
+  std::string contents;
+  std::vector<char> buf(4096);
+  ssize_t n;
+  while ((n = ReadFd(fd, buf.data(), buf.size())) > 0) {
+    contents.append(buf.data(), n);
+  }
+  TEST_PCHECK(n == 0);
+  return contents;
+}
+
+TEST(FAdvise64Test, SequentialReadsWithAdvice) {
+  const std::string contents = RandomContents(kSequentialFileSize);
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), contents, 0644));
+
+  for (int advice : {POSIX_FADV_NORMAL, POSIX_FADV_SEQUENTIAL,
+                     POSIX_FADV_RANDOM, POSIX_FADV_WILLNEED,
+                     POSIX_FADV_DONTNEED}) {
+    SCOPED_TRACE(absl::StrCat("advice ", advice));
+    const auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+    ASSERT_THAT(syscall(__NR_fadvise64, fd.get(), 0, 0, advice),
+                SyscallSucceeds());
+    EXPECT_EQ(ReadSequentially(fd.get()), contents);
+  }
+}
+
+TEST(FAdvise64Test, DontNeedAfterRead) {
+  const std::string contents = RandomContents(kSequentialFileSize);
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), contents, 0644));
+  const auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+
+  EXPECT_EQ(ReadSequentially(fd.get()), contents);
+  ASSERT_THAT(syscall(__NR_fadvise64, fd.get(), 0, 0, POSIX_FADV_DONTNEED),
+              SyscallSucceeds());
+  ASSERT_THAT(lseek(fd.get(), 0, SEEK_SET), SyscallSucceeds());
+  EXPECT_EQ(ReadSequentially(fd.get()), contents);
+}
+
+TEST(FAdvise64Test, DontNeedPreservesWrites) {
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDWR));
+  const std::string contents = RandomContents(1 << 20);
+  ASSERT_THAT(PwriteFd(fd.get(), contents.data(), contents.size(), 0),
+              SyscallSucceedsWithValue(contents.size()));
+
+  ASSERT_THAT(syscall(__NR_fadvise64, fd.get(), 0, 0, POSIX_FADV_DONTNEED),
+              SyscallSucceeds());
+
+  const auto fd2 = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+  EXPECT_EQ(ReadSequentially(fd2.get()), contents);
+}
+
+// Data written after it may have been read ahead must be visible to readers.
+TEST(FAdvise64Test, WriteAfterReadahead) {
+  const std::string contents = RandomContents(kSequentialFileSize);
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(
+      TempPath::CreateFileWith(GetAbsoluteTestTmpdir(), contents, 0644));
+  const auto rfd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+  const auto wfd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_WRONLY));
+
+  // Read the start of the file sequentially, then overwrite data following
+  // it through another file description.
+  std::vector<char> buf(4096);
+  for (int i = 0; i < 64; i++) {
+    ASSERT_THAT(ReadFd(rfd.get(), buf.data(), buf.size()),
+                SyscallSucceedsWithValue(buf.size()));
+  }
+  const std::string update = RandomContents(256 << 10);
+  constexpr off_t kUpdateOffset = 320 << 10;
+  ASSERT_THAT(PwriteFd(wfd.get(), update.data(), update.size(), kUpdateOffset),
+              SyscallSucceedsWithValue(update.size()));
+
+  std::string want = contents;
+  want.replace(kUpdateOffset, update.size(), update);
+  EXPECT_EQ(ReadSequentially(rfd.get()), want.substr(64 * buf.size()));
+}
+
 TEST(FAdvise64Test, FAdvise64WithOpath) {
   auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
   const auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_PATH));
@@ -14,8 +14,10 @@
 
 #include <errno.h>
 #include <fcntl.h>
+#include <linux/falloc.h>
 #include <signal.h>
 #include <sys/eventfd.h>
+#include <sys/mman.h>
 #include <sys/resource.h>
 #include <sys/signalfd.h>
 #include <sys/socket.h>
@@ -26,6 +28,7 @@
 #include <unistd.h>
 
 #include <ctime>
+#include <string>
 
 #include "gtest/gtest.h"
 #include "absl/strings/str_cat.h"
@@ -34,6 +37,7 @@
 #include "test/util/cleanup.h"
 #include "test/util/eventfd_util.h"
 #include "test/util/file_descriptor.h"
+#include "test/util/memory_util.h"
 #include "test/util/posix_error.h"
 #include "test/util/socket_util.h"
 #include "test/util/temp_path.h"
@@ -49,6 +53,26 @@ int fallocate(int fd, int mode, off_t offset, off_t len) {
 
 class AllocateTest : public FileTest {
   void SetUp() override { FileTest::SetUp(); }
+
+ protected:
+  // FillPages writes n pages to the test file, where the i-th page is filled
+  // with the character 'a' + i.
+  void FillPages(int n) {
+    for (int i = 0; i < n; i++) {
+      const std::string page(kPageSize, 'a' + i);
+      ASSERT_THAT(
+          PwriteFd(test_file_fd_.get(), page.data(), kPageSize, i * kPageSize),
+          SyscallSucceedsWithValue(kPageSize));
+    }
+  }
+
+  // ExpectContents expects the test file to contain len bytes of c at offset.
+  void ExpectContents(off_t offset, size_t len, char c) {
+    std::string buf(len, '\xff');
+    ASSERT_THAT(PreadFd(test_file_fd_.get(), buf.data(), len, offset),
+                SyscallSucceedsWithValue(len));
+    EXPECT_EQ(buf, std::string(len, c));
+  }
 };
 
 TEST_F(AllocateTest, Fallocate) {
@@ -89,6 +113,196 @@ TEST_F(AllocateTest, Fallocate) {
   EXPECT_EQ(buf.st_size, 40);
 }
 
+TEST_F(AllocateTest, FallocateKeepSize) {
+  ASSERT_THAT(fallocate(test_file_fd_.get(), FALLOC_FL_KEEP_SIZE, 0, 10),
+              SyscallSucceeds());
+  struct stat buf;
+  ASSERT_THAT(fstat(test_file_fd_.get(), &buf), SyscallSucceeds());
+  EXPECT_EQ(buf.st_size, 0);
+}
+
+TEST_F(AllocateTest, FallocateInvalidModes) {
+  // Unknown flags.
+  EXPECT_THAT(fallocate(test_file_fd_.get(), 0x80, 0, 10),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+
+  // FALLOC_FL_PUNCH_HOLE requires FALLOC_FL_KEEP_SIZE.
+  EXPECT_THAT(fallocate(test_file_fd_.get(), FALLOC_FL_PUNCH_HOLE, 0, 10),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+
+  // FALLOC_FL_PUNCH_HOLE and FALLOC_FL_ZERO_RANGE are mutually exclusive.
+  EXPECT_THAT(fallocate(test_file_fd_.get(),
+                        FALLOC_FL_PUNCH_HOLE | FALLOC_FL_ZERO_RANGE |
+                            FALLOC_FL_KEEP_SIZE,
+                        0, 10),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+
+  // FALLOC_FL_COLLAPSE_RANGE and FALLOC_FL_INSERT_RANGE must be used alone.
+  EXPECT_THAT(
+      fallocate(test_file_fd_.get(),
+                FALLOC_FL_COLLAPSE_RANGE | FALLOC_FL_KEEP_SIZE, 0, kPageSize),
+      SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(
+      fallocate(test_file_fd_.get(),
+                FALLOC_FL_INSERT_RANGE | FALLOC_FL_KEEP_SIZE, 0, kPageSize),
+      SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_F(AllocateTest, PunchHole) {
+  FillPages(3);
+  int ret = fallocate(test_file_fd_.get(),
+                      FALLOC_FL_PUNCH_HOLE | FALLOC_FL_KEEP_SIZE, kPageSize,
+                      kPageSize);
+  if (ret < 0 && errno == EOPNOTSUPP) {
+    GTEST_SKIP() << "Filesystem does not support FALLOC_FL_PUNCH_HOLE";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  struct stat buf;
+  ASSERT_THAT(fstat(test_file_fd_.get(), &buf), SyscallSucceeds());
+  EXPECT_EQ(buf.st_size, static_cast<off_t>(3 * kPageSize));
+
+  ExpectContents(0, kPageSize, 'a');
+  ExpectContents(kPageSize, kPageSize, '\0');
+  ExpectContents(2 * kPageSize, kPageSize, 'c');
+}
+
+TEST_F(AllocateTest, PunchHoleUnaligned) {
+  FillPages(1);
+  int ret = fallocate(test_file_fd_.get(),
+                      FALLOC_FL_PUNCH_HOLE | FALLOC_FL_KEEP_SIZE, 100, 200);
+  if (ret < 0 && errno == EOPNOTSUPP) {
+    GTEST_SKIP() << "Filesystem does not support FALLOC_FL_PUNCH_HOLE";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  ExpectContents(0, 100, 'a');
+  ExpectContents(100, 200, '\0');
+  ExpectContents(300, kPageSize - 300, 'a');
+}
+
+TEST_F(AllocateTest, PunchHoleReleasesBlocks) {
+  FillPages(4);
+  ASSERT_THAT(fsync(test_file_fd_.get()), SyscallSucceeds());
+  struct stat before;
+  ASSERT_THAT(fstat(test_file_fd_.get(), &before), SyscallSucceeds());
+
+  int ret = fallocate(test_file_fd_.get(),
+                      FALLOC_FL_PUNCH_HOLE | FALLOC_FL_KEEP_SIZE, 0,
+                      4 * kPageSize);
+  if (ret < 0 && errno == EOPNOTSUPP) {
+    GTEST_SKIP() << "Filesystem does not support FALLOC_FL_PUNCH_HOLE";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  struct stat after;
+  ASSERT_THAT(fstat(test_file_fd_.get(), &after), SyscallSucceeds());
+  EXPECT_EQ(after.st_size, before.st_size);
+  EXPECT_LT(after.st_blocks, before.st_blocks);
+}
+
+TEST_F(AllocateTest, PunchHoleSharedMapping) {
+  FillPages(2);
+  const Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      Mmap(nullptr, 2 * kPageSize, PROT_READ, MAP_SHARED, test_file_fd_.get(),
+           0));
+  const char* data = reinterpret_cast<const char*>(m.ptr());
+  ASSERT_EQ(data[0], 'a');
+  ASSERT_EQ(data[kPageSize], 'b');
+
+  int ret = fallocate(test_file_fd_.get(),
+                      FALLOC_FL_PUNCH_HOLE | FALLOC_FL_KEEP_SIZE, 0,
+                      kPageSize + 1);
+  if (ret < 0 && errno == EOPNOTSUPP) {
+    GTEST_SKIP() << "Filesystem does not support FALLOC_FL_PUNCH_HOLE";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  EXPECT_EQ(data[0], '\0');
+  EXPECT_EQ(data[kPageSize - 1], '\0');
+  EXPECT_EQ(data[kPageSize], '\0');
+  EXPECT_EQ(data[kPageSize + 1], 'b');
+}
+
+TEST_F(AllocateTest, PunchHoleSeekHoleAndData) {
+  FillPages(3);
+  int ret = fallocate(test_file_fd_.get(),
+                      FALLOC_FL_PUNCH_HOLE | FALLOC_FL_KEEP_SIZE, kPageSize,
+                      kPageSize);
+  if (ret < 0 && errno == EOPNOTSUPP) {
+    GTEST_SKIP() << "Filesystem does not support FALLOC_FL_PUNCH_HOLE";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  off_t hole = lseek(test_file_fd_.get(), 0, SEEK_HOLE);
+  ASSERT_THAT(hole, SyscallSucceeds());
+  // Filesystems that don't track holes report the whole file as data.
+  SKIP_IF(hole == static_cast<off_t>(3 * kPageSize));
+  EXPECT_EQ(hole, static_cast<off_t>(kPageSize));
+  EXPECT_THAT(lseek(test_file_fd_.get(), kPageSize, SEEK_DATA),
+              SyscallSucceedsWithValue(2 * kPageSize));
+  EXPECT_THAT(lseek(test_file_fd_.get(), 2 * kPageSize, SEEK_HOLE),
+              SyscallSucceedsWithValue(3 * kPageSize));
+  EXPECT_THAT(lseek(test_file_fd_.get(), 3 * kPageSize, SEEK_DATA),
+              SyscallFailsWithErrno(ENXIO));
+}
+
+TEST_F(AllocateTest, ZeroRange) {
+  FillPages(2);
+  int ret = fallocate(test_file_fd_.get(), FALLOC_FL_ZERO_RANGE, kPageSize / 2,
+                      2 * kPageSize);
+  if (ret < 0 && errno == EOPNOTSUPP) {
+    GTEST_SKIP() << "Filesystem does not support FALLOC_FL_ZERO_RANGE";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  // Zeroing past EOF without FALLOC_FL_KEEP_SIZE grows the file.
+  struct stat buf;
+  ASSERT_THAT(fstat(test_file_fd_.get(), &buf), SyscallSucceeds());
+  EXPECT_EQ(buf.st_size, static_cast<off_t>(kPageSize / 2 + 2 * kPageSize));
+
+  ExpectContents(0, kPageSize / 2, 'a');
+  ExpectContents(kPageSize / 2, 2 * kPageSize, '\0');
+}
+
+TEST_F(AllocateTest, ZeroRangeKeepSize) {
+  FillPages(2);
+  int ret = fallocate(test_file_fd_.get(),
+                      FALLOC_FL_ZERO_RANGE | FALLOC_FL_KEEP_SIZE, kPageSize,
+                      2 * kPageSize);
+  if (ret < 0 && errno == EOPNOTSUPP) {
+    GTEST_SKIP() << "Filesystem does not support FALLOC_FL_ZERO_RANGE";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  struct stat buf;
+  ASSERT_THAT(fstat(test_file_fd_.get(), &buf), SyscallSucceeds());
+  EXPECT_EQ(buf.st_size, static_cast<off_t>(2 * kPageSize));
+
+  ExpectContents(0, kPageSize, 'a');
+  ExpectContents(kPageSize, kPageSize, '\0');
+}
+
+TEST_F(AllocateTest, CollapseRange) {
+  FillPages(3);
+  int ret = fallocate(test_file_fd_.get(), FALLOC_FL_COLLAPSE_RANGE, kPageSize,
+                      kPageSize);
+  // Filesystems that support FALLOC_FL_COLLAPSE_RANGE may still reject
+  // ranges that are not aligned to their block size.
+  if (ret < 0 && (errno == EOPNOTSUPP || errno == EINVAL)) {
+    GTEST_SKIP() << "Filesystem does not support FALLOC_FL_COLLAPSE_RANGE "
+                    "at page granularity";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  struct stat buf;
+  ASSERT_THAT(fstat(test_file_fd_.get(), &buf), SyscallSucceeds());
+  EXPECT_EQ(buf.st_size, static_cast<off_t>(2 * kPageSize));
+
+  ExpectContents(0, kPageSize, 'a');
+  ExpectContents(kPageSize, kPageSize, 'c');
+}
+
 TEST_F(AllocateTest, FallocateInvalid) {
   // Invalid FD
   EXPECT_THAT(fallocate(-1, 0, 0, 10), SyscallFailsWithErrno(EBADF));
@@ -0,0 +1,246 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <fcntl.h>
+#include <sys/fanotify.h>
+#include <sys/ioctl.h>
+#include <sys/stat.h>
+#include <unistd.h>
+
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/posix_error.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+PosixErrorOr<FileDescriptor> FanotifyInit(unsigned int flags,
+                                          unsigned int event_f_flags) {
+  int fd = fanotify_init(flags, event_f_flags);
+  if (fd < 0) {
+    return PosixError(errno, "fanotify_init() failed");
+  }
+  return FileDescriptor(fd);
+}
+
+PosixError FanotifyMark(int fd, unsigned int flags, uint64_t mask,
+                        const std::string& path) {
+  if (fanotify_mark(fd, flags, mask, AT_FDCWD, path.c_str()) < 0) {
+    return PosixError(errno, "fanotify_mark() failed");
+  }
+  return NoError();
+}
+
+// ReadEvents reads all pending events from fd, which must be nonblocking.
+PosixErrorOr<std::vector<struct fanotify_event_metadata>> ReadEvents(int fd) {
+  std::vector<struct fanotify_event_metadata> events;
+  char buf[4096];
+  int n = read(fd, buf, sizeof(buf));
+  if (n < 0) {
+    if (errno == EAGAIN) {
+      return events;
+    }
+    return PosixError(errno, "read() failed");
+  }
+  auto* meta = reinterpret_cast<struct fanotify_event_metadata*>(buf);
+  for (; FAN_EVENT_OK(meta, n); meta = FAN_EVENT_NEXT(meta, n)) {
+    events.push_back(*meta);
+  }
+  return events;
+}
+
+// CloseEventFDs closes the file descriptors returned with events.
+void CloseEventFDs(const std::vector<struct fanotify_event_metadata>& events) {
+  for (const auto& event : events) {
+    if (event.fd != FAN_NOFD) {
+      close(event.fd);
+    }
+  }
+}
+
+TEST(FanotifyTest, InitRequiresNotificationClass) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  EXPECT_THAT(fanotify_init(FAN_CLASS_CONTENT, O_RDONLY),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(fanotify_init(FAN_CLASS_PRE_CONTENT, O_RDONLY),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(FanotifyTest, MarkRejectsPermissionEvents) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor fan = ASSERT_NO_ERRNO_AND_VALUE(
+      FanotifyInit(FAN_CLASS_NOTIF | FAN_NONBLOCK, O_RDONLY));
+
+  EXPECT_THAT(FanotifyMark(fan.get(), FAN_MARK_ADD, FAN_OPEN_PERM, file.path()),
+              PosixErrorIs(EINVAL, ::testing::_));
+}
+
+TEST(FanotifyTest, NonblockingReadWithoutEvents) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const FileDescriptor fan = ASSERT_NO_ERRNO_AND_VALUE(
+      FanotifyInit(FAN_CLASS_NOTIF | FAN_NONBLOCK, O_RDONLY));
+
+  char buf[FAN_EVENT_METADATA_LEN];
+  EXPECT_THAT(read(fan.get(), buf, sizeof(buf)),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+TEST(FanotifyTest, InodeMarkOpenAndCloseWrite) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor fan = ASSERT_NO_ERRNO_AND_VALUE(
+      FanotifyInit(FAN_CLASS_NOTIF | FAN_NONBLOCK, O_RDONLY));
+  ASSERT_NO_ERRNO(FanotifyMark(fan.get(), FAN_MARK_ADD,
+                               FAN_OPEN | FAN_CLOSE_WRITE, file.path()));
+
+  ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_WRONLY));
+
+  // The open and close events are merged, since they were generated by the
+  // same process for the same file.
+  auto events = ASSERT_NO_ERRNO_AND_VALUE(ReadEvents(fan.get()));
+  ASSERT_EQ(events.size(), 1);
+  EXPECT_EQ(events[0].vers, FANOTIFY_METADATA_VERSION);
+  EXPECT_EQ(events[0].mask, FAN_OPEN | FAN_CLOSE_WRITE);
+  EXPECT_EQ(events[0].pid, getpid());
+
+  // The event includes a file descriptor for the file.
+  ASSERT_NE(events[0].fd, FAN_NOFD);
+  struct stat event_st, file_st;
+  ASSERT_THAT(fstat(events[0].fd, &event_st), SyscallSucceeds());
+  ASSERT_THAT(stat(file.path().c_str(), &file_st), SyscallSucceeds());
+  EXPECT_EQ(event_st.st_dev, file_st.st_dev);
+  EXPECT_EQ(event_st.st_ino, file_st.st_ino);
+  CloseEventFDs(events);
+
+  // Neither the event file descriptor nor closing it generate events.
+  events = ASSERT_NO_ERRNO_AND_VALUE(ReadEvents(fan.get()));
+  EXPECT_EQ(events.size(), 0);
+}
+
+TEST(FanotifyTest, MountMarkModify) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_WRONLY));
+  const FileDescriptor fan = ASSERT_NO_ERRNO_AND_VALUE(
+      FanotifyInit(FAN_CLASS_NOTIF | FAN_NONBLOCK, O_RDONLY));
+  ASSERT_NO_ERRNO(FanotifyMark(fan.get(), FAN_MARK_ADD | FAN_MARK_MOUNT,
+                               FAN_MODIFY, GetAbsoluteTestTmpdir()));
+
+  ASSERT_THAT(WriteFd(fd.get(), "x", 1), SyscallSucceedsWithValue(1));
+
+  int n;
+  ASSERT_THAT(ioctl(fan.get(), FIONREAD, &n), SyscallSucceeds());
+  EXPECT_EQ(n, FAN_EVENT_METADATA_LEN);
+
+  auto events = ASSERT_NO_ERRNO_AND_VALUE(ReadEvents(fan.get()));
+  ASSERT_EQ(events.size(), 1);
+  EXPECT_EQ(events[0].mask, FAN_MODIFY);
+  CloseEventFDs(events);
+}
+
+TEST(FanotifyTest, IgnoredMaskClearedOnModify) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor fan = ASSERT_NO_ERRNO_AND_VALUE(
+      FanotifyInit(FAN_CLASS_NOTIF | FAN_NONBLOCK, O_RDONLY));
+  ASSERT_NO_ERRNO(FanotifyMark(fan.get(), FAN_MARK_ADD,
+                               FAN_CLOSE_NOWRITE | FAN_CLOSE_WRITE,
+                               file.path()));
+  ASSERT_NO_ERRNO(FanotifyMark(fan.get(),
+                               FAN_MARK_ADD | FAN_MARK_IGNORED_MASK,
+                               FAN_CLOSE_NOWRITE, file.path()));
+
+  // FAN_CLOSE_NOWRITE is ignored.
+  ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+  auto events = ASSERT_NO_ERRNO_AND_VALUE(ReadEvents(fan.get()));
+  EXPECT_EQ(events.size(), 0);
+
+  // Modifying the file clears the ignored mask.
+  {
+    const FileDescriptor fd =
+        ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_WRONLY));
+    ASSERT_THAT(WriteFd(fd.get(), "x", 1), SyscallSucceedsWithValue(1));
+  }
+  events = ASSERT_NO_ERRNO_AND_VALUE(ReadEvents(fan.get()));
+  ASSERT_EQ(events.size(), 1);
+  EXPECT_EQ(events[0].mask, FAN_CLOSE_WRITE);
+  CloseEventFDs(events);
+
+  ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+  events = ASSERT_NO_ERRNO_AND_VALUE(ReadEvents(fan.get()));
+  ASSERT_EQ(events.size(), 1);
+  EXPECT_EQ(events[0].mask, FAN_CLOSE_NOWRITE);
+  CloseEventFDs(events);
+}
+
+TEST(FanotifyTest, DirectoryEventsRequireOnDir) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const FileDescriptor fan = ASSERT_NO_ERRNO_AND_VALUE(
+      FanotifyInit(FAN_CLASS_NOTIF | FAN_NONBLOCK, O_RDONLY));
+  ASSERT_NO_ERRNO(FanotifyMark(fan.get(), FAN_MARK_ADD, FAN_OPEN, dir.path()));
+
+  ASSERT_NO_ERRNO_AND_VALUE(Open(dir.path(), O_RDONLY | O_DIRECTORY));
+  auto events = ASSERT_NO_ERRNO_AND_VALUE(ReadEvents(fan.get()));
+  EXPECT_EQ(events.size(), 0);
+
+  ASSERT_NO_ERRNO(
+      FanotifyMark(fan.get(), FAN_MARK_ADD, FAN_OPEN | FAN_ONDIR, dir.path()));
+  ASSERT_NO_ERRNO_AND_VALUE(Open(dir.path(), O_RDONLY | O_DIRECTORY));
+  events = ASSERT_NO_ERRNO_AND_VALUE(ReadEvents(fan.get()));
+  ASSERT_EQ(events.size(), 1);
+  EXPECT_EQ(events[0].mask, FAN_OPEN | FAN_ONDIR);
+  CloseEventFDs(events);
+}
+
+TEST(FanotifyTest, RemoveMark) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor fan = ASSERT_NO_ERRNO_AND_VALUE(
+      FanotifyInit(FAN_CLASS_NOTIF | FAN_NONBLOCK, O_RDONLY));
+
+  EXPECT_THAT(FanotifyMark(fan.get(), FAN_MARK_REMOVE, FAN_OPEN, file.path()),
+              PosixErrorIs(ENOENT, ::testing::_));
+
+  ASSERT_NO_ERRNO(FanotifyMark(fan.get(), FAN_MARK_ADD, FAN_OPEN, file.path()));
+  ASSERT_NO_ERRNO(
+      FanotifyMark(fan.get(), FAN_MARK_REMOVE, FAN_OPEN, file.path()));
+
+  ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+  auto events = ASSERT_NO_ERRNO_AND_VALUE(ReadEvents(fan.get()));
+  EXPECT_EQ(events.size(), 0);
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -0,0 +1,248 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <fcntl.h>
+#include <sys/mount.h>
+#include <sys/stat.h>
+#include <unistd.h>
+
+#include <cstring>
+#include <string>
+
+#include "gtest/gtest.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/mount_util.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+#ifndef AT_HANDLE_FID
+#define AT_HANDLE_FID AT_REMOVEDIR
+#endif
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr char kContents[] = "file handle contents";
+
+// Handle is a struct file_handle with room for the largest possible handle.
+struct Handle {
+  unsigned int handle_bytes = MAX_HANDLE_SZ;
+  int handle_type = 0;
+  unsigned char f_handle[MAX_HANDLE_SZ] = {};
+
+  struct file_handle* get() {
+    return reinterpret_cast<struct file_handle*>(this);
+  }
+
+  bool operator==(const Handle& other) const {
+    return handle_bytes == other.handle_bytes &&
+           handle_type == other.handle_type &&
+           memcmp(f_handle, other.f_handle, handle_bytes) == 0;
+  }
+};
+
+PosixErrorOr<Handle> NameToHandle(const std::string& path, int flags) {
+  Handle h;
+  int mount_id;
+  if (name_to_handle_at(AT_FDCWD, path.c_str(), h.get(), &mount_id, flags) <
+      0) {
+    return PosixError(errno, "name_to_handle_at");
+  }
+  return h;
+}
+
+TEST(NameToHandleAtTest, Basic) {
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  Handle h;
+  int mount_id = -1;
+  ASSERT_THAT(
+      name_to_handle_at(AT_FDCWD, file.path().c_str(), h.get(), &mount_id, 0),
+      SyscallSucceeds());
+  EXPECT_GT(h.handle_bytes, 0);
+  EXPECT_LE(h.handle_bytes, MAX_HANDLE_SZ);
+  EXPECT_GE(mount_id, 0);
+}
+
+TEST(NameToHandleAtTest, Stable) {
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  Handle h1 = ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(file.path(), 0));
+  Handle h2 = ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(file.path(), 0));
+  EXPECT_TRUE(h1 == h2);
+
+  // AT_EMPTY_PATH on an FD for the file yields the same handle.
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+  Handle h3;
+  int mount_id;
+  ASSERT_THAT(
+      name_to_handle_at(fd.get(), "", h3.get(), &mount_id, AT_EMPTY_PATH),
+      SyscallSucceeds());
+  EXPECT_TRUE(h1 == h3);
+}
+
+TEST(NameToHandleAtTest, Overflow) {
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  Handle h;
+  h.handle_bytes = 0;
+  int mount_id;
+  ASSERT_THAT(
+      name_to_handle_at(AT_FDCWD, file.path().c_str(), h.get(), &mount_id, 0),
+      SyscallFailsWithErrno(EOVERFLOW));
+  // handle_bytes is updated with the required size.
+  EXPECT_GT(h.handle_bytes, 0);
+  EXPECT_THAT(
+      name_to_handle_at(AT_FDCWD, file.path().c_str(), h.get(), &mount_id, 0),
+      SyscallSucceeds());
+}
+
+TEST(NameToHandleAtTest, InvalidArguments) {
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  Handle h;
+  int mount_id;
+  h.handle_bytes = MAX_HANDLE_SZ + 1;
+  EXPECT_THAT(
+      name_to_handle_at(AT_FDCWD, file.path().c_str(), h.get(), &mount_id, 0),
+      SyscallFailsWithErrno(EINVAL));
+  h.handle_bytes = MAX_HANDLE_SZ;
+  EXPECT_THAT(name_to_handle_at(AT_FDCWD, file.path().c_str(), h.get(),
+                                &mount_id, AT_SYMLINK_NOFOLLOW),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+class OpenByHandleAtTest : public ::testing::Test {
+ protected:
+  void SetUp() override {
+    SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_READ_SEARCH)));
+    dir_ = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+    mount_fd_ = ASSERT_NO_ERRNO_AND_VALUE(
+        Open(dir_.path(), O_RDONLY | O_DIRECTORY));
+  }
+
+  TempPath dir_;
+  FileDescriptor mount_fd_;
+};
+
+TEST_F(OpenByHandleAtTest, ReadContents) {
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      dir_.path(), kContents, TempPath::kDefaultFileMode));
+  Handle h = ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(file.path(), 0));
+
+  int fd;
+  ASSERT_THAT(fd = open_by_handle_at(mount_fd_.get(), h.get(), O_RDONLY),
+              SyscallSucceeds());
+  FileDescriptor file_fd(fd);
+  char buf[sizeof(kContents)] = {};
+  EXPECT_THAT(ReadFd(file_fd.get(), buf, sizeof(kContents) - 1),
+              SyscallSucceedsWithValue(sizeof(kContents) - 1));
+  EXPECT_STREQ(buf, kContents);
+}
+
+TEST_F(OpenByHandleAtTest, Directory) {
+  auto subdir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDirIn(dir_.path()));
+  Handle h = ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(subdir.path(), 0));
+  int fd;
+  ASSERT_THAT(fd = open_by_handle_at(mount_fd_.get(), h.get(),
+                                     O_RDONLY | O_DIRECTORY),
+              SyscallSucceeds());
+  FileDescriptor dir_fd(fd);
+  struct stat got, want;
+  ASSERT_THAT(fstat(dir_fd.get(), &got), SyscallSucceeds());
+  ASSERT_THAT(stat(subdir.path().c_str(), &want), SyscallSucceeds());
+  EXPECT_EQ(got.st_ino, want.st_ino);
+}
+
+TEST_F(OpenByHandleAtTest, Renamed) {
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      dir_.path(), kContents, TempPath::kDefaultFileMode));
+  Handle h = ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(file.path(), 0));
+  const std::string newpath = NewTempAbsPathInDir(dir_.path());
+  ASSERT_THAT(rename(file.path().c_str(), newpath.c_str()), SyscallSucceeds());
+  file.reset(newpath);
+
+  int fd;
+  ASSERT_THAT(fd = open_by_handle_at(mount_fd_.get(), h.get(), O_RDONLY),
+              SyscallSucceeds());
+  FileDescriptor file_fd(fd);
+  char buf[sizeof(kContents)] = {};
+  EXPECT_THAT(ReadFd(file_fd.get(), buf, sizeof(kContents) - 1),
+              SyscallSucceedsWithValue(sizeof(kContents) - 1));
+  EXPECT_STREQ(buf, kContents);
+}
+
+TEST_F(OpenByHandleAtTest, Deleted) {
+  const std::string path = NewTempAbsPathInDir(dir_.path());
+  ASSERT_NO_ERRNO(CreateWithContents(path, kContents));
+  Handle h = ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(path, 0));
+  ASSERT_THAT(unlink(path.c_str()), SyscallSucceeds());
+  EXPECT_THAT(open_by_handle_at(mount_fd_.get(), h.get(), O_RDONLY),
+              SyscallFailsWithErrno(ESTALE));
+}
+
+TEST_F(OpenByHandleAtTest, InvalidHandle) {
+  Handle h;
+  h.handle_bytes = 0;
+  EXPECT_THAT(open_by_handle_at(mount_fd_.get(), h.get(), O_RDONLY),
+              SyscallFailsWithErrno(EINVAL));
+  h.handle_bytes = MAX_HANDLE_SZ + 1;
+  EXPECT_THAT(open_by_handle_at(mount_fd_.get(), h.get(), O_RDONLY),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_F(OpenByHandleAtTest, RequiresCapability) {
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileIn(dir_.path()));
+  Handle h = ASSERT_NO_ERRNO_AND_VALUE(NameToHandle(file.path(), 0));
+  AutoCapability cap(CAP_DAC_READ_SEARCH, false);
+  EXPECT_THAT(open_by_handle_at(mount_fd_.get(), h.get(), O_RDONLY),
+              SyscallFailsWithErrno(EPERM));
+}
+
+TEST(FileHandleTmpfsTest, HandleFID) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount =
+      ASSERT_NO_ERRNO_AND_VALUE(Mount("", dir.path(), "tmpfs", 0, "", 0));
+  const std::string path = JoinPath(dir.path(), "file");
+  ASSERT_NO_ERRNO(CreateWithContents(path, kContents));
+
+  Handle h;
+  int mount_id;
+  int ret = name_to_handle_at(AT_FDCWD, path.c_str(), h.get(), &mount_id,
+                              AT_HANDLE_FID);
+  // AT_HANDLE_FID is not supported before Linux 6.5.
+  SKIP_IF(!IsRunningOnGvisor() && ret < 0 && errno == EINVAL);
+  ASSERT_THAT(ret, SyscallSucceeds());
+
+  if (ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_READ_SEARCH))) {
+    const FileDescriptor mount_fd =
+        ASSERT_NO_ERRNO_AND_VALUE(Open(dir.path(), O_RDONLY | O_DIRECTORY));
+    int fd;
+    ASSERT_THAT(fd = open_by_handle_at(mount_fd.get(), h.get(), O_RDONLY),
+                SyscallSucceeds());
+    FileDescriptor file_fd(fd);
+
+    ASSERT_THAT(unlink(path.c_str()), SyscallSucceeds());
+    file_fd.reset();
+    EXPECT_THAT(open_by_handle_at(mount_fd.get(), h.get(), O_RDONLY),
+                SyscallFailsWithErrno(ESTALE));
+  }
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
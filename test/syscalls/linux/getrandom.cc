@@ -12,8 +12,10 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <string.h>
 #include <sys/syscall.h>
 #include <sys/types.h>
+#include <sys/wait.h>
 #include <unistd.h>
 
 #include "gtest/gtest.h"
@@ -36,6 +38,16 @@ namespace {
 #endif
 #endif  // SYS_getrandom
 
+#ifndef GRND_NONBLOCK
+#define GRND_NONBLOCK 0x1
+#endif
+#ifndef GRND_RANDOM
+#define GRND_RANDOM 0x2
+#endif
+
+// GRND_INSECURE may be missing from older headers.
+constexpr int kGrndInsecure = 0x4;
+
 bool SomeByteIsNonZero(char* random_bytes, int length) {
   for (int i = 0; i < length; i++) {
     if (random_bytes[i] != 0) {
@@ -57,6 +69,73 @@ TEST(GetrandomTest, IsRandom) {
   EXPECT_TRUE(SomeByteIsNonZero(random_bytes, n));
 }
 
+TEST(GetrandomTest, Flags) {
+  char random_bytes[64] = {};
+  int n = syscall(SYS_getrandom, random_bytes, sizeof(random_bytes), 0);
+  SKIP_IF(!IsRunningOnGvisor() && n < 0 && errno == ENOSYS);
+
+  for (int flags : {GRND_NONBLOCK, GRND_RANDOM, GRND_RANDOM | GRND_NONBLOCK}) {
+    EXPECT_THAT(
+        syscall(SYS_getrandom, random_bytes, sizeof(random_bytes), flags),
+        SyscallSucceedsWithValue(sizeof(random_bytes)));
+  }
+  EXPECT_THAT(syscall(SYS_getrandom, random_bytes, sizeof(random_bytes), 0x8),
+              SyscallFailsWithErrno(EINVAL));
+
+  // GRND_INSECURE was added in Linux 5.6.
+  n = syscall(SYS_getrandom, random_bytes, sizeof(random_bytes),
+              kGrndInsecure);
+  SKIP_IF(!IsRunningOnGvisor() && n < 0 && errno == EINVAL);
+  EXPECT_EQ(n, sizeof(random_bytes));
+  EXPECT_THAT(syscall(SYS_getrandom, random_bytes, sizeof(random_bytes),
+                      kGrndInsecure | GRND_RANDOM),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(GetrandomTest, DifferentEachCall) {
+  char a[32] = {};
+  char b[32] = {};
+  int n = syscall(SYS_getrandom, a, sizeof(a), 0);
+  SKIP_IF(!IsRunningOnGvisor() && n < 0 && errno == ENOSYS);
+  ASSERT_THAT(n, SyscallSucceedsWithValue(sizeof(a)));
+  ASSERT_THAT(syscall(SYS_getrandom, b, sizeof(b), 0),
+              SyscallSucceedsWithValue(sizeof(b)));
+  EXPECT_NE(memcmp(a, b, sizeof(a)), 0);
+}
+
+TEST(GetrandomTest, DifferentAfterFork) {
+  char parent[32] = {};
+  int n = syscall(SYS_getrandom, parent, sizeof(parent), 0);
+  SKIP_IF(!IsRunningOnGvisor() && n < 0 && errno == ENOSYS);
+  ASSERT_THAT(n, SyscallSucceeds());
+
+  int pipefds[2];
+  ASSERT_THAT(pipe(pipefds), SyscallSucceeds());
+  pid_t pid = fork();
+  if (pid == 0) {
+    char child[32] = {};
+    TEST_PCHECK(syscall(SYS_getrandom, child, sizeof(child), 0) ==
+                sizeof(child));
+    TEST_PCHECK(write(pipefds[1], child, sizeof(child)) == sizeof(child));
+    _exit(0);
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  close(pipefds[1]);
+
+  // The parent's next output must differ from the child's.
+  ASSERT_THAT(syscall(SYS_getrandom, parent, sizeof(parent), 0),
+              SyscallSucceeds());
+  char child[32] = {};
+  ASSERT_THAT(ReadFd(pipefds[0], child, sizeof(child)),
+              SyscallSucceedsWithValue(sizeof(child)));
+  close(pipefds[0]);
+  EXPECT_NE(memcmp(parent, child, sizeof(child)), 0);
+
+  int status;
+  ASSERT_THAT(waitpid(pid, &status, 0), SyscallSucceedsWithValue(pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0);
+}
+
 }  // namespace
 
 }  // namespace testing
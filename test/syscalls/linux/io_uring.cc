@@ -13,6 +13,7 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <fcntl.h>
 #include <pthread.h>
 #include <stdio.h>
 #include <stdlib.h>
@@ -21,15 +22,25 @@
 #include <sys/mman.h>
 #include <sys/stat.h>
 #include <sys/types.h>
+#include <sys/uio.h>
 #include <unistd.h>
 
 #include <cstddef>
 #include <cstdint>
+#include <string>
 
 #include "gtest/gtest.h"
+#include "absl/strings/numbers.h"
+#include "absl/strings/str_cat.h"
+#include "absl/strings/str_split.h"
+#include "absl/strings/string_view.h"
+#include "absl/strings/strip.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
 #include "test/util/io_uring_util.h"
 #include "test/util/memory_util.h"
 #include "test/util/multiprocess_util.h"
+#include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
 
@@ -180,6 +191,11 @@ TEST(IOUringTest, ReturnedParamsValues) {
 
     // gVisor should support IORING_FEAT_SINGLE_MMAP.
     EXPECT_NE((params.features & IORING_FEAT_SINGLE_MMAP), 0);
+    EXPECT_NE((params.features & IORING_FEAT_SUBMIT_STABLE), 0);
+    EXPECT_NE((params.features & IORING_FEAT_RW_CUR_POS), 0);
+
+    // Completions are dropped when the completion queue is full.
+    EXPECT_EQ((params.features & IORING_FEAT_NODROP), 0);
   }
 }
 
@@ -589,6 +605,228 @@ TEST(IOUringTest, OverflowCQTest) {
   }
 }
 
+// Submits the SQE at index 0 of a single-entry io_uring, waits for its
+// completion, and returns the completion's result.
+int SubmitAndWait(IOUring *io_uring, uint64_t user_data) {
+  uint32_t sq_tail = io_uring->load_sq_tail();
+  io_uring->store_sq_tail(sq_tail + 1);
+
+  int ret = io_uring->Enter(1, 1, IORING_ENTER_GETEVENTS, nullptr);
+  EXPECT_EQ(ret, 1);
+
+  uint32_t cq_head = io_uring->load_cq_head();
+  EXPECT_EQ(io_uring->load_cq_tail(), cq_head + 1);
+  IOUringCqe *cqe = &io_uring->get_cqes()[cq_head & 1];
+  EXPECT_EQ(cqe->user_data, user_data);
+  int res = cqe->res;
+  io_uring->store_cq_head(cq_head + 1);
+  return res;
+}
+
+// Testing that io_uring_enter(2) successfully handles IORING_OP_WRITE and
+// IORING_OP_READ operations on a regular file.
+TEST(IOUringTest, ReadWriteTest) {
+  IOUringParams params;
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDWR));
+
+  constexpr char kData[] = "io_uring";
+  IOUringSqe *sqe = io_uring->get_sqes();
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->opcode = IORING_OP_WRITE;
+  sqe->fd = fd.get();
+  sqe->off = 0;
+  sqe->addr = reinterpret_cast<uint64_t>(kData);
+  sqe->len = sizeof(kData);
+  sqe->user_data = 42;
+  EXPECT_EQ(SubmitAndWait(io_uring.get(), 42), static_cast<int>(sizeof(kData)));
+
+  char buf[sizeof(kData)] = {};
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->opcode = IORING_OP_READ;
+  sqe->fd = fd.get();
+  sqe->off = 0;
+  sqe->addr = reinterpret_cast<uint64_t>(buf);
+  sqe->len = sizeof(buf);
+  sqe->user_data = 43;
+  EXPECT_EQ(SubmitAndWait(io_uring.get(), 43), static_cast<int>(sizeof(buf)));
+  EXPECT_EQ(memcmp(buf, kData, sizeof(kData)), 0);
+
+  // Reading at EOF returns 0.
+  sqe->off = sizeof(kData);
+  sqe->user_data = 44;
+  EXPECT_EQ(SubmitAndWait(io_uring.get(), 44), 0);
+}
+
+// Testing that io_uring_enter(2) successfully handles IORING_OP_WRITEV,
+// IORING_OP_FSYNC and IORING_OP_READV operations on a regular file.
+TEST(IOUringTest, ReadvWritevFsyncTest) {
+  IOUringParams params;
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDWR));
+
+  char first[] = "hello, ";
+  char second[] = "world";
+  struct iovec iovs[2] = {
+      {first, sizeof(first) - 1},
+      {second, sizeof(second) - 1},
+  };
+  IOUringSqe *sqe = io_uring->get_sqes();
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->opcode = IORING_OP_WRITEV;
+  sqe->fd = fd.get();
+  sqe->off = 0;
+  sqe->addr = reinterpret_cast<uint64_t>(iovs);
+  sqe->len = 2;
+  sqe->user_data = 42;
+  EXPECT_EQ(SubmitAndWait(io_uring.get(), 42), 12);
+
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->opcode = IORING_OP_FSYNC;
+  sqe->fd = fd.get();
+  sqe->user_data = 43;
+  EXPECT_EQ(SubmitAndWait(io_uring.get(), 43), 0);
+
+  char buf[12] = {};
+  struct iovec riov = {buf, sizeof(buf)};
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->opcode = IORING_OP_READV;
+  sqe->fd = fd.get();
+  sqe->off = 0;
+  sqe->addr = reinterpret_cast<uint64_t>(&riov);
+  sqe->len = 1;
+  sqe->user_data = 44;
+  EXPECT_EQ(SubmitAndWait(io_uring.get(), 44), static_cast<int>(sizeof(buf)));
+  EXPECT_EQ(std::string(buf, sizeof(buf)), "hello, world");
+}
+
+// Testing that an offset of -1 uses and updates the file offset.
+TEST(IOUringTest, CurrentPositionTest) {
+  IOUringParams params;
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+  ASSERT_NE(params.features & IORING_FEAT_RW_CUR_POS, 0);
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDWR));
+
+  constexpr char kData[] = "abcd";
+  IOUringSqe *sqe = io_uring->get_sqes();
+  for (int i = 0; i < 2; i++) {
+    memset(sqe, 0, sizeof(*sqe));
+    sqe->opcode = IORING_OP_WRITE;
+    sqe->fd = fd.get();
+    sqe->off = -1;
+    sqe->addr = reinterpret_cast<uint64_t>(kData);
+    sqe->len = sizeof(kData) - 1;
+    sqe->user_data = 42 + i;
+    EXPECT_EQ(SubmitAndWait(io_uring.get(), 42 + i),
+              static_cast<int>(sizeof(kData) - 1));
+  }
+  EXPECT_THAT(lseek(fd.get(), 0, SEEK_CUR),
+              SyscallSucceedsWithValue(2 * (sizeof(kData) - 1)));
+}
+
+// Testing that IORING_OP_READ reads from a pipe, which doesn't support
+// positional reads.
+TEST(IOUringTest, ReadPipeTest) {
+  IOUringParams params;
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+
+  int pipe_fds[2];
+  ASSERT_THAT(pipe(pipe_fds), SyscallSucceeds());
+  const FileDescriptor rfd(pipe_fds[0]);
+  const FileDescriptor wfd(pipe_fds[1]);
+
+  constexpr char kData[] = "pipe";
+  ASSERT_THAT(write(wfd.get(), kData, sizeof(kData)),
+              SyscallSucceedsWithValue(sizeof(kData)));
+
+  char buf[sizeof(kData)] = {};
+  IOUringSqe *sqe = io_uring->get_sqes();
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->opcode = IORING_OP_READ;
+  sqe->fd = rfd.get();
+  sqe->addr = reinterpret_cast<uint64_t>(buf);
+  sqe->len = sizeof(buf);
+  sqe->user_data = 42;
+  EXPECT_EQ(SubmitAndWait(io_uring.get(), 42), static_cast<int>(sizeof(buf)));
+  EXPECT_EQ(memcmp(buf, kData, sizeof(kData)), 0);
+}
+
+// Testing that operations on invalid file descriptors complete with EBADF.
+TEST(IOUringTest, BadFDTest) {
+  IOUringParams params;
+  std::unique_ptr<IOUring> io_uring =
+      ASSERT_NO_ERRNO_AND_VALUE(IOUring::InitIOUring(1, params));
+
+  char buf[8];
+  IOUringSqe *sqe = io_uring->get_sqes();
+  memset(sqe, 0, sizeof(*sqe));
+  sqe->opcode = IORING_OP_READ;
+  sqe->fd = -1;
+  sqe->addr = reinterpret_cast<uint64_t>(buf);
+  sqe->len = sizeof(buf);
+  sqe->user_data = 42;
+  EXPECT_EQ(SubmitAndWait(io_uring.get(), 42), -EBADF);
+}
+
+// Testing that registering fixed buffers fails with EINVAL, since they are
+// not supported.
+TEST(IOUringTest, RegisterBuffersUnsupported) {
+  if (IsRunningOnGvisor()) {
+    IOUringParams params;
+    FileDescriptor iouringfd =
+        ASSERT_NO_ERRNO_AND_VALUE(NewIOUringFD(1, params));
+
+    char buf[8];
+    struct iovec iov = {buf, sizeof(buf)};
+    EXPECT_THAT(
+        IOUringRegister(iouringfd.get(), IORING_REGISTER_BUFFERS, &iov, 1),
+        SyscallFailsWithErrno(EINVAL));
+  }
+}
+
+// Returns the value of VmPin in /proc/self/status in kB.
+PosixErrorOr<uint64_t> VmPinKB() {
+  ASSIGN_OR_RETURN_ERRNO(std::string status,
+                         GetContents("/proc/self/status"));
+  for (absl::string_view line : absl::StrSplit(status, '\n')) {
+    if (absl::ConsumePrefix(&line, "VmPin:")) {
+      uint64_t val;
+      if (!absl::SimpleAtoi(absl::StripSuffix(line, " kB"), &val)) {
+        return PosixError(EINVAL, absl::StrCat("invalid VmPin: ", line));
+      }
+      return val;
+    }
+  }
+  return PosixError(ENOENT, "no VmPin in /proc/self/status");
+}
+
+// Testing that the memory backing the rings is charged to the task.
+TEST(IOUringTest, RingsMemoryAccounted) {
+  if (IsRunningOnGvisor()) {
+    uint64_t before = ASSERT_NO_ERRNO_AND_VALUE(VmPinKB());
+    {
+      IOUringParams params;
+      FileDescriptor iouringfd =
+          ASSERT_NO_ERRNO_AND_VALUE(NewIOUringFD(64, params));
+      EXPECT_GT(ASSERT_NO_ERRNO_AND_VALUE(VmPinKB()), before);
+    }
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(VmPinKB()), before);
+  }
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -0,0 +1,249 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <stdint.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/strings/match.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/fs_util.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/posix_error.h"
+#include "test/util/test_util.h"
+#include "test/util/thread_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// Definitions from include/uapi/linux/keyctl.h, which may not be available in
+// the build environment.
+constexpr int32_t kThreadKeyring = -1;
+constexpr int32_t kProcessKeyring = -2;
+constexpr int32_t kSessionKeyring = -3;
+
+constexpr int kGetKeyringID = 0;
+constexpr int kJoinSessionKeyring = 1;
+constexpr int kUpdate = 2;
+constexpr int kRevoke = 3;
+constexpr int kSetPerm = 5;
+constexpr int kDescribe = 6;
+constexpr int kLink = 8;
+constexpr int kUnlink = 9;
+constexpr int kSearch = 10;
+constexpr int kRead = 11;
+
+constexpr uint32_t kPosView = 0x01000000;
+constexpr uint32_t kPosSetAttr = 0x20000000;
+
+int32_t add_key(const char* type, const char* desc, const void* payload,
+                size_t plen, int32_t keyring) {
+  return syscall(SYS_add_key, type, desc, payload, plen, keyring);
+}
+
+long keyctl(int op, unsigned long arg2 = 0, unsigned long arg3 = 0,
+            unsigned long arg4 = 0, unsigned long arg5 = 0) {
+  return syscall(SYS_keyctl, op, arg2, arg3, arg4, arg5);
+}
+
+// JoinNewSession subscribes the caller to a new anonymous session keyring, so
+// that tests don't interfere with each other.
+PosixErrorOr<int32_t> JoinNewSession() {
+  long ret = keyctl(kJoinSessionKeyring, 0);
+  if (ret < 0) {
+    return PosixError(errno, "keyctl(KEYCTL_JOIN_SESSION_KEYRING)");
+  }
+  return ret;
+}
+
+std::string ReadKey(int32_t key) {
+  char buf[64] = {};
+  long ret = keyctl(kRead, key, reinterpret_cast<unsigned long>(buf),
+                    sizeof(buf));
+  if (ret < 0) {
+    return "";
+  }
+  return std::string(buf, ret);
+}
+
+TEST(KeyctlTest, AddAndReadUserKey) {
+  const int32_t session = ASSERT_NO_ERRNO_AND_VALUE(JoinNewSession());
+  EXPECT_THAT(keyctl(kGetKeyringID, kSessionKeyring, 0),
+              SyscallSucceedsWithValue(session));
+
+  int32_t key;
+  ASSERT_THAT(key = add_key("user", "test:key", "secret", 6, kSessionKeyring),
+              SyscallSucceeds());
+  EXPECT_EQ(ReadKey(key), "secret");
+
+  char desc[256] = {};
+  ASSERT_THAT(keyctl(kDescribe, key, reinterpret_cast<unsigned long>(desc),
+                     sizeof(desc)),
+              SyscallSucceeds());
+  EXPECT_TRUE(absl::StartsWith(desc, "user;")) << desc;
+  EXPECT_TRUE(absl::EndsWith(desc, ";test:key")) << desc;
+
+  // The session keyring lists the new key.
+  int32_t links[4] = {};
+  ASSERT_THAT(keyctl(kRead, session, reinterpret_cast<unsigned long>(links),
+                     sizeof(links)),
+              SyscallSucceedsWithValue(sizeof(int32_t)));
+  EXPECT_EQ(links[0], key);
+}
+
+TEST(KeyctlTest, AddExistingKeyUpdates) {
+  ASSERT_NO_ERRNO(JoinNewSession());
+
+  int32_t key;
+  ASSERT_THAT(key = add_key("user", "test:key", "old", 3, kSessionKeyring),
+              SyscallSucceeds());
+  EXPECT_THAT(add_key("user", "test:key", "new", 3, kSessionKeyring),
+              SyscallSucceedsWithValue(key));
+  EXPECT_EQ(ReadKey(key), "new");
+
+  ASSERT_THAT(keyctl(kUpdate, key, reinterpret_cast<unsigned long>("newer"), 5),
+              SyscallSucceeds());
+  EXPECT_EQ(ReadKey(key), "newer");
+}
+
+TEST(KeyctlTest, InvalidArguments) {
+  ASSERT_NO_ERRNO(JoinNewSession());
+
+  EXPECT_THAT(add_key("nosuchtype", "test:key", "", 0, kSessionKeyring),
+              SyscallFailsWithErrno(ENODEV));
+  EXPECT_THAT(add_key("keyring", "test:ring", "x", 1, kSessionKeyring),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(keyctl(kRead, 0x7fffffff, 0, 0), SyscallFailsWithErrno(ENOKEY));
+}
+
+TEST(KeyctlTest, Revoke) {
+  ASSERT_NO_ERRNO(JoinNewSession());
+
+  int32_t key;
+  ASSERT_THAT(key = add_key("user", "test:key", "secret", 6, kSessionKeyring),
+              SyscallSucceeds());
+  ASSERT_THAT(keyctl(kRevoke, key), SyscallSucceeds());
+  EXPECT_THAT(keyctl(kRead, key, 0, 0), SyscallFailsWithErrno(EKEYREVOKED));
+
+  // Revoked keys can still be unlinked.
+  EXPECT_THAT(keyctl(kUnlink, key, kSessionKeyring), SyscallSucceeds());
+  EXPECT_THAT(keyctl(kUnlink, key, kSessionKeyring),
+              SyscallFailsWithErrno(ENOENT));
+}
+
+TEST(KeyctlTest, SearchNestedKeyring) {
+  ASSERT_NO_ERRNO(JoinNewSession());
+
+  int32_t ring;
+  ASSERT_THAT(ring = add_key("keyring", "test:ring", nullptr, 0,
+                             kSessionKeyring),
+              SyscallSucceeds());
+  int32_t key;
+  ASSERT_THAT(key = add_key("user", "test:key", "secret", 6, ring),
+              SyscallSucceeds());
+
+  EXPECT_THAT(keyctl(kSearch, kSessionKeyring,
+                     reinterpret_cast<unsigned long>("user"),
+                     reinterpret_cast<unsigned long>("test:key"), 0),
+              SyscallSucceedsWithValue(key));
+  EXPECT_THAT(keyctl(kSearch, kSessionKeyring,
+                     reinterpret_cast<unsigned long>("user"),
+                     reinterpret_cast<unsigned long>("test:missing"), 0),
+              SyscallFailsWithErrno(ENOKEY));
+}
+
+TEST(KeyctlTest, LinkCycle) {
+  ASSERT_NO_ERRNO(JoinNewSession());
+
+  int32_t outer;
+  ASSERT_THAT(outer = add_key("keyring", "test:outer", nullptr, 0,
+                              kSessionKeyring),
+              SyscallSucceeds());
+  int32_t inner;
+  ASSERT_THAT(inner = add_key("keyring", "test:inner", nullptr, 0, outer),
+              SyscallSucceeds());
+  EXPECT_THAT(keyctl(kLink, outer, inner), SyscallFailsWithErrno(EDEADLK));
+  EXPECT_THAT(keyctl(kLink, outer, outer), SyscallFailsWithErrno(EDEADLK));
+}
+
+TEST(KeyctlTest, SetPerm) {
+  ASSERT_NO_ERRNO(JoinNewSession());
+
+  int32_t key;
+  ASSERT_THAT(key = add_key("user", "test:key", "secret", 6, kSessionKeyring),
+              SyscallSucceeds());
+  ASSERT_THAT(keyctl(kSetPerm, key, kPosView | kPosSetAttr), SyscallSucceeds());
+  EXPECT_THAT(keyctl(kRead, key, 0, 0), SyscallFailsWithErrno(EACCES));
+  EXPECT_THAT(keyctl(kSetPerm, key, 0xc0000000), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(KeyctlTest, SessionKeyringInheritedByFork) {
+  const int32_t session = ASSERT_NO_ERRNO_AND_VALUE(JoinNewSession());
+  int32_t key;
+  ASSERT_THAT(key = add_key("user", "test:key", "secret", 6, kSessionKeyring),
+              SyscallSucceeds());
+  ASSERT_THAT(keyctl(kGetKeyringID, kProcessKeyring, 1), SyscallSucceeds());
+
+  const auto rest = [&] {
+    TEST_CHECK(keyctl(kGetKeyringID, kSessionKeyring, 0) == session);
+    TEST_CHECK(ReadKey(key) == "secret");
+    // Process keyrings aren't inherited by child processes.
+    long ret = keyctl(kGetKeyringID, kProcessKeyring, 0);
+    TEST_CHECK(ret < 0 && errno == ENOKEY);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(KeyctlTest, ThreadKeyringIsPerThread) {
+  ASSERT_NO_ERRNO(JoinNewSession());
+  ASSERT_THAT(keyctl(kGetKeyringID, kThreadKeyring, 1), SyscallSucceeds());
+  int32_t process;
+  ASSERT_THAT(process = keyctl(kGetKeyringID, kProcessKeyring, 1),
+              SyscallSucceeds());
+
+  ScopedThread t([&] {
+    EXPECT_THAT(keyctl(kGetKeyringID, kThreadKeyring, 0),
+                SyscallFailsWithErrno(ENOKEY));
+    EXPECT_THAT(keyctl(kGetKeyringID, kProcessKeyring, 0),
+                SyscallSucceedsWithValue(process));
+  });
+}
+
+TEST(KeyctlTest, ProcKeys) {
+  ASSERT_NO_ERRNO(JoinNewSession());
+  int32_t key;
+  ASSERT_THAT(key = add_key("user", "test:proc", "secret", 6, kSessionKeyring),
+              SyscallSucceeds());
+
+  const std::string keys = ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/keys"));
+  EXPECT_TRUE(
+      absl::StrContains(keys, absl::StrCat(absl::Hex(key, absl::kZeroPad8))))
+      << keys;
+  EXPECT_TRUE(absl::StrContains(keys, "test:proc: 6")) << keys;
+
+  const std::string maxkeys = ASSERT_NO_ERRNO_AND_VALUE(
+      GetContents("/proc/sys/kernel/keys/maxkeys"));
+  EXPECT_GT(std::stoi(maxkeys), 0);
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -0,0 +1,368 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <fcntl.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <sys/prctl.h>
+#include <sys/stat.h>
+#include <sys/syscall.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/logging.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/posix_error.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+#if defined(__x86_64__) || defined(__aarch64__)
+#ifndef SYS_landlock_create_ruleset
+#define SYS_landlock_create_ruleset 444
+#endif
+#ifndef SYS_landlock_add_rule
+#define SYS_landlock_add_rule 445
+#endif
+#ifndef SYS_landlock_restrict_self
+#define SYS_landlock_restrict_self 446
+#endif
+#else
+#error "Unknown architecture"
+#endif
+
+// Definitions from include/uapi/linux/landlock.h, which may not be available
+// in the build environment.
+constexpr uint32_t kCreateRulesetVersion = 1 << 0;
+constexpr int kRulePathBeneath = 1;
+
+constexpr uint64_t kAccessExecute = 1 << 0;
+constexpr uint64_t kAccessWriteFile = 1 << 1;
+constexpr uint64_t kAccessReadFile = 1 << 2;
+constexpr uint64_t kAccessReadDir = 1 << 3;
+constexpr uint64_t kAccessRemoveFile = 1 << 5;
+constexpr uint64_t kAccessMakeDir = 1 << 7;
+constexpr uint64_t kAccessMakeReg = 1 << 8;
+
+struct RulesetAttr {
+  uint64_t handled_access_fs;
+};
+
+struct __attribute__((packed)) PathBeneathAttr {
+  uint64_t allowed_access;
+  int32_t parent_fd;
+};
+
+int landlock_create_ruleset(const RulesetAttr* attr, size_t size,
+                            uint32_t flags) {
+  return syscall(SYS_landlock_create_ruleset, attr, size, flags);
+}
+
+int landlock_add_rule(int ruleset_fd, int rule_type, const void* rule_attr,
+                      uint32_t flags) {
+  return syscall(SYS_landlock_add_rule, ruleset_fd, rule_type, rule_attr,
+                 flags);
+}
+
+int landlock_restrict_self(int ruleset_fd, uint32_t flags) {
+  return syscall(SYS_landlock_restrict_self, ruleset_fd, flags);
+}
+
+// SKIP_IF_NO_LANDLOCK skips the test if Landlock is not supported.
+#define SKIP_IF_NO_LANDLOCK()                                          \
+  SKIP_IF(landlock_create_ruleset(nullptr, 0, kCreateRulesetVersion) < 0 && \
+          (errno == ENOSYS || errno == EOPNOTSUPP))
+
+// CreateRuleset returns a new ruleset handling handled.
+PosixErrorOr<FileDescriptor> CreateRuleset(uint64_t handled) {
+  RulesetAttr attr = {handled};
+  int fd = landlock_create_ruleset(&attr, sizeof(attr), 0);
+  if (fd < 0) {
+    return PosixError(errno, "landlock_create_ruleset");
+  }
+  return FileDescriptor(fd);
+}
+
+// AddPathRule grants allowed beneath path in ruleset.
+PosixError AddPathRule(const FileDescriptor& ruleset, const std::string& path,
+                       uint64_t allowed) {
+  int fd = open(path.c_str(), O_PATH | O_CLOEXEC);
+  if (fd < 0) {
+    return PosixError(errno, absl::StrCat("open ", path));
+  }
+  FileDescriptor parent(fd);
+  PathBeneathAttr attr = {allowed, parent.get()};
+  if (landlock_add_rule(ruleset.get(), kRulePathBeneath, &attr, 0) < 0) {
+    return PosixError(errno, "landlock_add_rule");
+  }
+  return NoError();
+}
+
+// RestrictSelf enforces ruleset on the calling thread. Since Landlock can't be
+// disabled once enforced, it should only be called in a forked process.
+void RestrictSelf(const FileDescriptor& ruleset) {
+  TEST_PCHECK(prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) == 0);
+  TEST_PCHECK(landlock_restrict_self(ruleset.get(), 0) == 0);
+}
+
+TEST(LandlockTest, ABIVersion) {
+  SKIP_IF_NO_LANDLOCK();
+  EXPECT_THAT(landlock_create_ruleset(nullptr, 0, kCreateRulesetVersion),
+              SyscallSucceedsWithValue(::testing::Ge(1)));
+}
+
+TEST(LandlockTest, CreateRulesetInvalid) {
+  SKIP_IF_NO_LANDLOCK();
+  RulesetAttr attr = {kAccessReadFile};
+  EXPECT_THAT(landlock_create_ruleset(&attr, sizeof(attr), 1 << 1),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(
+      landlock_create_ruleset(&attr, sizeof(attr), kCreateRulesetVersion),
+      SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(landlock_create_ruleset(&attr, sizeof(attr) - 1, 0),
+              SyscallFailsWithErrno(EINVAL));
+  attr.handled_access_fs = 0;
+  EXPECT_THAT(landlock_create_ruleset(&attr, sizeof(attr), 0),
+              SyscallFailsWithErrno(ENOMSG));
+  attr.handled_access_fs = uint64_t{1} << 63;
+  EXPECT_THAT(landlock_create_ruleset(&attr, sizeof(attr), 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(LandlockTest, CreateRulesetLargerAttr) {
+  SKIP_IF_NO_LANDLOCK();
+  struct {
+    RulesetAttr attr;
+    uint64_t extra;
+  } big = {{kAccessReadFile}, 0};
+  FileDescriptor fd(landlock_create_ruleset(&big.attr, sizeof(big), 0));
+  EXPECT_GE(fd.get(), 0);
+  EXPECT_THAT(fcntl(fd.get(), F_GETFD), SyscallSucceedsWithValue(FD_CLOEXEC));
+
+  big.extra = 1;
+  EXPECT_THAT(landlock_create_ruleset(&big.attr, sizeof(big), 0),
+              SyscallFailsWithErrno(E2BIG));
+}
+
+TEST(LandlockTest, AddRuleInvalid) {
+  SKIP_IF_NO_LANDLOCK();
+  const FileDescriptor ruleset = ASSERT_NO_ERRNO_AND_VALUE(
+      CreateRuleset(kAccessReadFile | kAccessReadDir));
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const TempPath file =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileIn(dir.path()));
+  const FileDescriptor dirfd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(dir.path(), O_PATH));
+  const FileDescriptor filefd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_PATH));
+  const FileDescriptor notruleset =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+
+  PathBeneathAttr attr = {0, dirfd.get()};
+  EXPECT_THAT(landlock_add_rule(ruleset.get(), kRulePathBeneath, &attr, 0),
+              SyscallFailsWithErrno(ENOMSG));
+
+  // Access rights that are not handled by the ruleset.
+  attr.allowed_access = kAccessWriteFile;
+  EXPECT_THAT(landlock_add_rule(ruleset.get(), kRulePathBeneath, &attr, 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Directory access rights on a file.
+  attr = {kAccessReadDir, filefd.get()};
+  EXPECT_THAT(landlock_add_rule(ruleset.get(), kRulePathBeneath, &attr, 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  attr = {kAccessReadFile, dirfd.get()};
+  EXPECT_THAT(landlock_add_rule(ruleset.get(), kRulePathBeneath, &attr, 1),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(landlock_add_rule(ruleset.get(), kRulePathBeneath + 1, &attr, 0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(landlock_add_rule(notruleset.get(), kRulePathBeneath, &attr, 0),
+              SyscallFailsWithErrno(EBADFD));
+  EXPECT_THAT(landlock_add_rule(ruleset.get(), kRulePathBeneath, &attr, 0),
+              SyscallSucceeds());
+}
+
+TEST(LandlockTest, RestrictSelfInvalid) {
+  SKIP_IF_NO_LANDLOCK();
+  const FileDescriptor ruleset =
+      ASSERT_NO_ERRNO_AND_VALUE(CreateRuleset(kAccessReadFile));
+  EXPECT_THAT(landlock_restrict_self(ruleset.get(), 1),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(landlock_restrict_self(-1, 0), SyscallFailsWithErrno(EBADF));
+}
+
+TEST(LandlockTest, Open) {
+  SKIP_IF_NO_LANDLOCK();
+  const TempPath allowed = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const TempPath denied = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const TempPath allowed_file =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileIn(allowed.path()));
+  const TempPath denied_file =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileIn(denied.path()));
+  const FileDescriptor ruleset = ASSERT_NO_ERRNO_AND_VALUE(
+      CreateRuleset(kAccessReadFile | kAccessWriteFile | kAccessReadDir));
+  ASSERT_NO_ERRNO(AddPathRule(ruleset, allowed.path(),
+                              kAccessReadFile | kAccessReadDir));
+
+  const auto rest = [&] {
+    RestrictSelf(ruleset);
+    int fd;
+    TEST_CHECK_SUCCESS(fd = open(allowed_file.path().c_str(), O_RDONLY));
+    close(fd);
+    TEST_CHECK_SUCCESS(fd = open(allowed.path().c_str(), O_RDONLY));
+    close(fd);
+    TEST_CHECK_ERRNO(open(allowed_file.path().c_str(), O_WRONLY), EACCES);
+    TEST_CHECK_ERRNO(open(denied_file.path().c_str(), O_RDONLY), EACCES);
+    TEST_CHECK_ERRNO(open(denied.path().c_str(), O_RDONLY), EACCES);
+    // O_PATH file descriptors are not restricted.
+    TEST_CHECK_SUCCESS(fd = open(denied_file.path().c_str(), O_PATH));
+    close(fd);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(LandlockTest, CreateAndRemoveFiles) {
+  SKIP_IF_NO_LANDLOCK();
+  const TempPath allowed = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const TempPath denied = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const TempPath denied_file =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileIn(denied.path()));
+  const std::string allowed_file = JoinPath(allowed.path(), "file");
+  const std::string allowed_dir = JoinPath(allowed.path(), "dir");
+  const FileDescriptor ruleset = ASSERT_NO_ERRNO_AND_VALUE(CreateRuleset(
+      kAccessMakeReg | kAccessMakeDir | kAccessRemoveFile));
+  ASSERT_NO_ERRNO(AddPathRule(ruleset, allowed.path(),
+                              kAccessMakeReg | kAccessMakeDir |
+                                  kAccessRemoveFile));
+
+  const auto rest = [&] {
+    RestrictSelf(ruleset);
+    int fd;
+    TEST_CHECK_SUCCESS(fd = open(allowed_file.c_str(), O_CREAT | O_RDWR, 0644));
+    close(fd);
+    TEST_CHECK_SUCCESS(unlink(allowed_file.c_str()));
+    TEST_CHECK_SUCCESS(mkdir(allowed_dir.c_str(), 0755));
+
+    TEST_CHECK_ERRNO(
+        open(JoinPath(denied.path(), "file").c_str(), O_CREAT | O_RDWR, 0644),
+        EACCES);
+    TEST_CHECK_ERRNO(mkdir(JoinPath(denied.path(), "dir").c_str(), 0755),
+                     EACCES);
+    TEST_CHECK_ERRNO(unlink(denied_file.path().c_str()), EACCES);
+    // Opening an existing file with O_CREAT doesn't create it.
+    TEST_CHECK_SUCCESS(fd = open(denied_file.path().c_str(), O_CREAT | O_RDWR));
+    close(fd);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+  // Clean up the directory created by the child.
+  EXPECT_THAT(rmdir(allowed_dir.c_str()), SyscallSucceeds());
+}
+
+TEST(LandlockTest, Rename) {
+  SKIP_IF_NO_LANDLOCK();
+  const TempPath dir1 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const TempPath dir2 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const TempPath file =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileIn(dir1.path()));
+  const std::string renamed = JoinPath(dir1.path(), "renamed");
+  const FileDescriptor ruleset = ASSERT_NO_ERRNO_AND_VALUE(
+      CreateRuleset(kAccessMakeReg | kAccessRemoveFile));
+  ASSERT_NO_ERRNO(AddPathRule(ruleset, dir1.path(),
+                              kAccessMakeReg | kAccessRemoveFile));
+  ASSERT_NO_ERRNO(AddPathRule(ruleset, dir2.path(),
+                              kAccessMakeReg | kAccessRemoveFile));
+
+  const auto rest = [&] {
+    RestrictSelf(ruleset);
+    // Files can't be moved to other directories, even if both directories
+    // allow it.
+    TEST_CHECK_ERRNO(
+        rename(file.path().c_str(), JoinPath(dir2.path(), "file").c_str()),
+        EXDEV);
+    TEST_CHECK_SUCCESS(rename(file.path().c_str(), renamed.c_str()));
+    TEST_CHECK_SUCCESS(rename(renamed.c_str(), file.path().c_str()));
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(LandlockTest, Execute) {
+  SKIP_IF_NO_LANDLOCK();
+  const FileDescriptor ruleset =
+      ASSERT_NO_ERRNO_AND_VALUE(CreateRuleset(kAccessExecute));
+
+  const auto rest = [&] {
+    RestrictSelf(ruleset);
+    char* const argv[] = {const_cast<char*>("/bin/true"), nullptr};
+    char* const envp[] = {nullptr};
+    TEST_CHECK_ERRNO(execve("/bin/true", argv, envp), EACCES);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(LandlockTest, StackedAndInherited) {
+  SKIP_IF_NO_LANDLOCK();
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const TempPath file =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileIn(dir.path()));
+  const FileDescriptor ruleset =
+      ASSERT_NO_ERRNO_AND_VALUE(CreateRuleset(kAccessReadFile));
+  ASSERT_NO_ERRNO(AddPathRule(ruleset, "/", kAccessReadFile));
+
+  const auto rest = [&] {
+    RestrictSelf(ruleset);
+    int fd;
+    TEST_CHECK_SUCCESS(fd = open(file.path().c_str(), O_RDONLY));
+    close(fd);
+
+    // Stack a second ruleset that denies reading any file. Every layer must
+    // grant access.
+    RulesetAttr attr = {kAccessReadFile};
+    int ruleset2;
+    TEST_CHECK_SUCCESS(ruleset2 =
+                           landlock_create_ruleset(&attr, sizeof(attr), 0));
+    TEST_CHECK_SUCCESS(landlock_restrict_self(ruleset2, 0));
+    close(ruleset2);
+    TEST_CHECK_ERRNO(open(file.path().c_str(), O_RDONLY), EACCES);
+
+    // Children inherit the restrictions.
+    pid_t child = fork();
+    if (child == 0) {
+      TEST_CHECK_ERRNO(open(file.path().c_str(), O_RDONLY), EACCES);
+      _exit(0);
+    }
+    TEST_PCHECK(child > 0);
+    int status;
+    TEST_PCHECK(waitpid(child, &status, 0) == child);
+    TEST_CHECK(WIFEXITED(status) && WEXITSTATUS(status) == 0);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -50,8 +50,6 @@ bool IsSameFile(const std::string& f1, const std::string& f2) {
   return stat1.st_dev == stat2.st_dev && stat1.st_ino == stat2.st_ino;
 }
 
-// TODO(b/178640646): Add test for linkat with AT_EMPTY_PATH
-
 TEST(LinkTest, CanCreateLinkFile) {
   auto oldfile = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
   const std::string newname = NewTempAbsPath();
@@ -349,6 +347,121 @@ TEST(LinkTest, LinkatWithSymlinkFollow) {
   EXPECT_THAT(unlink(newname.c_str()), SyscallSucceeds());
 }
 
+// OpenTmpfile opens an unnamed file in dir with O_TMPFILE and flags. If the
+// filesystem does not support O_TMPFILE, *supported is set to false.
+PosixErrorOr<FileDescriptor> OpenTmpfile(const std::string& dir, int flags,
+                                         bool* supported) {
+  auto fd_or = Open(dir, O_TMPFILE | flags, 0600);
+  *supported = fd_or.ok() || fd_or.error().errno_value() != EOPNOTSUPP;
+  return fd_or;
+}
+
+TEST(LinkTest, TmpfileLinkatEmptyPath) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_DAC_READ_SEARCH)));
+
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  bool supported;
+  auto fd_or = OpenTmpfile(dir.path(), O_RDWR, &supported);
+  SKIP_IF(!supported);
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(std::move(fd_or));
+
+  constexpr char kData[] = "tmpfile";
+  ASSERT_THAT(WriteFd(fd.get(), kData, sizeof(kData)),
+              SyscallSucceedsWithValue(sizeof(kData)));
+
+  // The file has no name yet, but can still be inspected and changed.
+  struct stat st;
+  ASSERT_THAT(fstat(fd.get(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_nlink, 0);
+  EXPECT_EQ(st.st_size, sizeof(kData));
+  EXPECT_TRUE(S_ISREG(st.st_mode));
+  ASSERT_THAT(fchmod(fd.get(), 0640), SyscallSucceeds());
+  ASSERT_THAT(fstat(fd.get(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_mode & 0777, 0640);
+
+  const std::string newname = JoinPath(dir.path(), "linked");
+  ASSERT_THAT(linkat(fd.get(), "", AT_FDCWD, newname.c_str(), AT_EMPTY_PATH),
+              SyscallSucceeds());
+
+  struct stat linked;
+  ASSERT_THAT(stat(newname.c_str(), &linked), SyscallSucceeds());
+  EXPECT_EQ(linked.st_nlink, 1);
+  EXPECT_EQ(linked.st_mode & 0777, 0640);
+  ASSERT_THAT(fstat(fd.get(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_ino, linked.st_ino);
+  EXPECT_EQ(st.st_nlink, 1);
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(newname)),
+            std::string(kData, sizeof(kData)));
+
+  EXPECT_THAT(unlink(newname.c_str()), SyscallSucceeds());
+}
+
+TEST(LinkTest, TmpfileLinkatProcSelfFD) {
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  bool supported;
+  auto fd_or = OpenTmpfile(dir.path(), O_WRONLY, &supported);
+  SKIP_IF(!supported);
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(std::move(fd_or));
+
+  const std::string newname = JoinPath(dir.path(), "linked");
+  const std::string fdpath = absl::StrCat("/proc/self/fd/", fd.get());
+  ASSERT_THAT(linkat(AT_FDCWD, fdpath.c_str(), AT_FDCWD, newname.c_str(),
+                     AT_SYMLINK_FOLLOW),
+              SyscallSucceeds());
+
+  struct stat st;
+  ASSERT_THAT(fstat(fd.get(), &st), SyscallSucceeds());
+  struct stat linked;
+  ASSERT_THAT(stat(newname.c_str(), &linked), SyscallSucceeds());
+  EXPECT_EQ(st.st_ino, linked.st_ino);
+
+  // A second name for a file that already has one is just a hard link.
+  const std::string newname2 = JoinPath(dir.path(), "linked2");
+  ASSERT_THAT(linkat(AT_FDCWD, fdpath.c_str(), AT_FDCWD, newname2.c_str(),
+                     AT_SYMLINK_FOLLOW),
+              SyscallSucceeds());
+  ASSERT_THAT(stat(newname.c_str(), &linked), SyscallSucceeds());
+  EXPECT_EQ(linked.st_nlink, 2);
+
+  EXPECT_THAT(unlink(newname.c_str()), SyscallSucceeds());
+  EXPECT_THAT(unlink(newname2.c_str()), SyscallSucceeds());
+}
+
+TEST(LinkTest, TmpfileExclCannotBeLinked) {
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  bool supported;
+  auto fd_or = OpenTmpfile(dir.path(), O_RDWR | O_EXCL, &supported);
+  SKIP_IF(!supported);
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(std::move(fd_or));
+
+  const std::string newname = JoinPath(dir.path(), "linked");
+  const std::string fdpath = absl::StrCat("/proc/self/fd/", fd.get());
+  EXPECT_THAT(linkat(AT_FDCWD, fdpath.c_str(), AT_FDCWD, newname.c_str(),
+                     AT_SYMLINK_FOLLOW),
+              SyscallFailsWithErrno(ENOENT));
+}
+
+TEST(LinkTest, TmpfileLinkatOtherFilesystem) {
+  const TempPath dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  bool supported;
+  auto fd_or = OpenTmpfile(dir.path(), O_RDWR, &supported);
+  SKIP_IF(!supported);
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(std::move(fd_or));
+
+  // /dev/shm is a tmpfs mount, which is only useful here if the test
+  // directory is elsewhere.
+  struct stat st;
+  ASSERT_THAT(fstat(fd.get(), &st), SyscallSucceeds());
+  struct stat shm;
+  SKIP_IF(stat("/dev/shm", &shm) != 0 || shm.st_dev == st.st_dev);
+
+  const std::string newname = NewTempAbsPathInDir("/dev/shm");
+  const std::string fdpath = absl::StrCat("/proc/self/fd/", fd.get());
+  EXPECT_THAT(linkat(AT_FDCWD, fdpath.c_str(), AT_FDCWD, newname.c_str(),
+                     AT_SYMLINK_FOLLOW),
+              SyscallFailsWithErrno(EXDEV));
+}
+
 }  // namespace
 
 }  // namespace testing
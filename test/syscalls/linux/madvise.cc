@@ -17,7 +17,9 @@
 #include <string.h>
 #include <sys/mman.h>
 #include <sys/stat.h>
+#include <sys/syscall.h>
 #include <sys/types.h>
+#include <sys/uio.h>
 #include <sys/wait.h>
 #include <unistd.h>
 
@@ -25,6 +27,7 @@
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "test/util/capability_util.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/logging.h"
 #include "test/util/memory_util.h"
@@ -36,6 +39,19 @@
 namespace gvisor {
 namespace testing {
 
+#ifndef MADV_COLD
+#define MADV_COLD 20
+#endif
+#ifndef MADV_PAGEOUT
+#define MADV_PAGEOUT 21
+#endif
+#ifndef SYS_pidfd_open
+#define SYS_pidfd_open 434
+#endif
+#ifndef SYS_process_madvise
+#define SYS_process_madvise 440
+#endif
+
 namespace {
 
 void ExpectAllMappingBytes(Mapping const& m, char c) {
@@ -245,6 +261,139 @@ TEST(MadviseDontforkTest, DontforkAnonPrivate) {
   ExpectAllMappingBytes(mp3, 3);
 }
 
+// Skips the current test if MADV_COLD and MADV_PAGEOUT are not supported, as
+// on Linux before 5.4.
+void SkipIfPageoutNotSupported() {
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  int ret = madvise(m.ptr(), m.len(), MADV_PAGEOUT);
+  if (ret < 0 && errno == EINVAL) {
+    GTEST_SKIP() << "MADV_PAGEOUT not supported";
+  }
+  ASSERT_THAT(ret, SyscallSucceeds());
+}
+
+TEST(MadvisePageoutTest, PreservesPrivateAnonPage) {
+  SkipIfPageoutNotSupported();
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  memset(m.ptr(), 8, m.len());
+  ASSERT_THAT(madvise(m.ptr(), m.len(), MADV_PAGEOUT), SyscallSucceeds());
+  ExpectAllMappingBytes(m, 8);
+  ASSERT_THAT(madvise(m.ptr(), m.len(), MADV_COLD), SyscallSucceeds());
+  ExpectAllMappingBytes(m, 8);
+}
+
+TEST(MadvisePageoutTest, PreservesZeroedPrivateAnonPage) {
+  SkipIfPageoutNotSupported();
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  memset(m.ptr(), 9, m.len());
+  memset(m.ptr(), 0, m.len());
+  ASSERT_THAT(madvise(m.ptr(), m.len(), MADV_PAGEOUT), SyscallSucceeds());
+  ExpectAllMappingBytes(m, 0);
+
+  // The page must still be writable after being paged out.
+  memset(m.ptr(), 10, m.len());
+  ExpectAllMappingBytes(m, 10);
+}
+
+TEST(MadvisePageoutTest, PreservesCOWAnonPageInParent) {
+  SkipIfPageoutNotSupported();
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  memset(m.ptr(), 0, m.len());
+
+  // Page out the page in the child while it's still shared with the parent,
+  // then write to it in the parent.
+  const auto rest = [&] {
+    TEST_PCHECK(madvise(m.ptr(), m.len(), MADV_PAGEOUT) == 0);
+    CheckAllMappingBytes(m, 0);
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+  ExpectAllMappingBytes(m, 0);
+  memset(m.ptr(), 11, m.len());
+  ExpectAllMappingBytes(m, 11);
+}
+
+TEST(MadvisePageoutTest, PreservesSharedFilePage) {
+  SkipIfPageoutNotSupported();
+  TempPath f = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      /* parent = */ GetAbsoluteTestTmpdir(),
+      /* content = */ std::string(kPageSize, 12), TempPath::kDefaultFileMode));
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(f.path(), O_RDWR));
+
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(Mmap(
+      nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED, fd.get(), 0));
+  ExpectAllMappingBytes(m, 12);
+  memset(m.ptr(), 13, m.len());
+  ASSERT_THAT(madvise(m.ptr(), m.len(), MADV_PAGEOUT), SyscallSucceeds());
+  ExpectAllMappingBytes(m, 13);
+}
+
+TEST(MadvisePageoutTest, Unmapped) {
+  SkipIfPageoutNotSupported();
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  ASSERT_THAT(munmap(reinterpret_cast<char*>(m.ptr()) + kPageSize, kPageSize),
+              SyscallSucceeds());
+  EXPECT_THAT(madvise(m.ptr(), m.len(), MADV_PAGEOUT),
+              SyscallFailsWithErrno(ENOMEM));
+}
+
+TEST(ProcessMadviseTest, Self) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_NICE)));
+  int pidfd = syscall(SYS_pidfd_open, getpid(), 0);
+  if (pidfd < 0 && errno == ENOSYS) {
+    GTEST_SKIP() << "pidfd_open not supported";
+  }
+  ASSERT_THAT(pidfd, SyscallSucceeds());
+  FileDescriptor fd(pidfd);
+
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  memset(m.ptr(), 14, m.len());
+  struct iovec iov[2] = {
+      {m.ptr(), kPageSize},
+      {reinterpret_cast<char*>(m.ptr()) + kPageSize, kPageSize},
+  };
+  int ret = syscall(SYS_process_madvise, fd.get(), iov, 2, MADV_PAGEOUT, 0);
+  if (ret < 0 && errno == ENOSYS) {
+    GTEST_SKIP() << "process_madvise not supported";
+  }
+  ASSERT_THAT(ret, SyscallSucceedsWithValue(2 * kPageSize));
+  ExpectAllMappingBytes(m, 14);
+}
+
+TEST(ProcessMadviseTest, InvalidArguments) {
+  int pidfd = syscall(SYS_pidfd_open, getpid(), 0);
+  if (pidfd < 0 && errno == ENOSYS) {
+    GTEST_SKIP() << "pidfd_open not supported";
+  }
+  ASSERT_THAT(pidfd, SyscallSucceeds());
+  FileDescriptor fd(pidfd);
+
+  auto m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  struct iovec iov = {m.ptr(), kPageSize};
+  int ret = syscall(SYS_process_madvise, fd.get(), &iov, 1, MADV_COLD, 0);
+  if (ret < 0 && errno == ENOSYS) {
+    GTEST_SKIP() << "process_madvise not supported";
+  }
+
+  // Non-zero flags.
+  EXPECT_THAT(syscall(SYS_process_madvise, fd.get(), &iov, 1, MADV_COLD, 1),
+              SyscallFailsWithErrno(EINVAL));
+  // Advice with application-visible side effects.
+  EXPECT_THAT(
+      syscall(SYS_process_madvise, fd.get(), &iov, 1, MADV_DONTNEED, 0),
+      SyscallFailsWithErrno(EINVAL));
+  // Not a pidfd.
+  FileDescriptor other = ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+  EXPECT_THAT(syscall(SYS_process_madvise, other.get(), &iov, 1, MADV_COLD, 0),
+              SyscallFailsWithErrno(EBADF));
+}
+
 }  // namespace
 
 }  // namespace testing
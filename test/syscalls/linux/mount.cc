@@ -21,6 +21,8 @@
 #include <sys/resource.h>
 #include <sys/signalfd.h>
 #include <sys/stat.h>
+#include <sys/statfs.h>
+#include <sys/syscall.h>
 #include <unistd.h>
 
 #include <functional>
@@ -57,8 +59,43 @@ namespace {
 
 using ::testing::AnyOf;
 using ::testing::Contains;
+using ::testing::HasSubstr;
 using ::testing::Pair;
 
+#ifndef SYS_open_tree
+#define SYS_open_tree 428
+#endif
+#ifndef SYS_move_mount
+#define SYS_move_mount 429
+#endif
+#ifndef SYS_fsopen
+#define SYS_fsopen 430
+#endif
+#ifndef SYS_fsconfig
+#define SYS_fsconfig 431
+#endif
+#ifndef SYS_fsmount
+#define SYS_fsmount 432
+#endif
+#ifndef SYS_mount_setattr
+#define SYS_mount_setattr 442
+#endif
+
+constexpr int kOpenTreeClone = 0x1;
+constexpr int kMoveMountFEmptyPath = 0x4;
+constexpr int kFsconfigSetString = 1;
+constexpr int kFsconfigCmdCreate = 6;
+constexpr uint64_t kMountAttrRdonly = 0x1;
+constexpr uint64_t kMountAttrNoexec = 0x8;
+constexpr int kAtRecursive = 0x8000;
+
+struct MountAttr {
+  uint64_t attr_set;
+  uint64_t attr_clr;
+  uint64_t propagation;
+  uint64_t userns_fd;
+};
+
 TEST(MountTest, MountBadFilesystem) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
 
@@ -761,6 +798,73 @@ TEST(MountTest, TmpfsSizeMmap) {
   EXPECT_THAT(munmap(addr, 2 * kPageSize), SyscallSucceeds());
 }
 
+TEST(MountTest, TmpfsSizeStatfs) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto tmpfs_size_opt = absl::StrCat("size=", 4 * kPageSize);
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", 0, tmpfs_size_opt, 0));
+  auto fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(dir.path(), "foo"), O_CREAT | O_RDWR, 0777));
+  ASSERT_THAT(fallocate(fd.get(), 0, 0, kPageSize), SyscallSucceeds());
+
+  struct statfs st;
+  ASSERT_THAT(statfs(dir.path().c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.f_bsize, kPageSize);
+  EXPECT_EQ(st.f_blocks, 4);
+  EXPECT_EQ(st.f_bfree, 3);
+  EXPECT_EQ(st.f_bavail, 3);
+}
+
+TEST(MountTest, TmpfsRemountSize) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(Mount(
+      "", dir.path(), "tmpfs", 0, absl::StrCat("size=", kPageSize), 0));
+  auto fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(dir.path(), "foo"), O_CREAT | O_RDWR, 0777));
+  ASSERT_THAT(fallocate(fd.get(), 0, 0, kPageSize), SyscallSucceeds());
+  ASSERT_THAT(fallocate(fd.get(), 0, 0, 2 * kPageSize),
+              SyscallFailsWithErrno(ENOSPC));
+
+  // Grow the filesystem.
+  ASSERT_THAT(mount("", dir.path().c_str(), "tmpfs", MS_REMOUNT,
+                    absl::StrCat("size=", 3 * kPageSize).c_str()),
+              SyscallSucceeds());
+  ASSERT_THAT(fallocate(fd.get(), 0, 0, 2 * kPageSize), SyscallSucceeds());
+  struct statfs st;
+  ASSERT_THAT(statfs(dir.path().c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.f_blocks, 3);
+  EXPECT_EQ(st.f_bfree, 1);
+
+  // Shrinking below the current usage fails.
+  EXPECT_THAT(mount("", dir.path().c_str(), "tmpfs", MS_REMOUNT,
+                    absl::StrCat("size=", kPageSize).c_str()),
+              SyscallFailsWithErrno(EINVAL));
+  ASSERT_THAT(statfs(dir.path().c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.f_blocks, 3);
+
+  // Shrinking to the current usage succeeds.
+  ASSERT_THAT(mount("", dir.path().c_str(), "tmpfs", MS_REMOUNT,
+                    absl::StrCat("size=", 2 * kPageSize).c_str()),
+              SyscallSucceeds());
+  ASSERT_THAT(statfs(dir.path().c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.f_blocks, 2);
+  EXPECT_EQ(st.f_bfree, 0);
+  EXPECT_THAT(fallocate(fd.get(), 0, 0, 3 * kPageSize),
+              SyscallFailsWithErrno(ENOSPC));
+}
+
+TEST(MountTest, TmpfsRemountCannotLimitUnlimitedSize) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount =
+      ASSERT_NO_ERRNO_AND_VALUE(Mount("", dir.path(), "tmpfs", 0, "", 0));
+  EXPECT_THAT(mount("", dir.path().c_str(), "tmpfs", MS_REMOUNT,
+                    absl::StrCat("size=", kPageSize).c_str()),
+              SyscallFailsWithErrno(EINVAL));
+}
+
 TEST(MountTest, SimpleBind) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
 
@@ -1356,6 +1460,288 @@ TEST(MountTest, BindParentToChild) {
   ASSERT_EQ(opt2, opt3);
 }
 
+TEST(MountTest, BindIsNotRecursive) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir1 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const dir2 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const child =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDirIn(dir1.path()));
+  auto const child_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", child.path(), "tmpfs", 0, "mode=0777", 0));
+  ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(child.path(), "foo"), O_CREAT | O_RDWR, 0777));
+
+  auto const bind_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount(dir1.path(), dir2.path(), "", MS_BIND, "", 0));
+
+  // The tmpfs mounted at child is not visible under dir2.
+  const std::string child2 = JoinPath(dir2.path(), Basename(child.path()));
+  ASSERT_NO_ERRNO(DirContains(child2, {}, {"foo"}));
+}
+
+TEST(MountTest, RecursiveBind) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir1 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const dir2 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const child =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDirIn(dir1.path()));
+  auto const child_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", child.path(), "tmpfs", 0, "mode=0777", 0));
+  auto const grandchild =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDirIn(child.path()));
+  auto const grandchild_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", grandchild.path(), "tmpfs", 0, "mode=0777", 0));
+  ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(grandchild.path(), "foo"), O_CREAT | O_RDWR, 0777));
+
+  // The cloned submounts keep the bind mount busy, so detach it on cleanup.
+  auto const bind_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount(dir1.path(), dir2.path(), "", MS_BIND | MS_REC, "", MNT_DETACH));
+
+  const std::string child2 = JoinPath(dir2.path(), Basename(child.path()));
+  const std::string grandchild2 =
+      JoinPath(child2, Basename(grandchild.path()));
+  ASSERT_NO_ERRNO(DirContains(grandchild2, {"foo"}, {}));
+
+  // Each cloned mount is a child of the clone of its parent.
+  std::vector<ProcMountInfoEntry> mounts =
+      ASSERT_NO_ERRNO_AND_VALUE(ProcSelfMountInfoEntries());
+  uint64_t bind_id = 0, child_id = 0, child_parent_id = 0,
+           grandchild_parent_id = 0;
+  for (const auto& e : mounts) {
+    if (e.mount_point == dir2.path()) {
+      bind_id = e.id;
+    }
+    if (e.mount_point == child2) {
+      child_id = e.id;
+      child_parent_id = e.parent_id;
+    }
+    if (e.mount_point == grandchild2) {
+      grandchild_parent_id = e.parent_id;
+    }
+  }
+  ASSERT_NE(bind_id, 0);
+  ASSERT_NE(child_id, 0);
+  EXPECT_EQ(child_parent_id, bind_id);
+  EXPECT_EQ(grandchild_parent_id, child_id);
+}
+
+TEST(MountTest, RecursiveBindOnlyIncludesReachableMounts) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir1 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const dir2 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir1.path(), "tmpfs", 0, "mode=0777", 0));
+  auto const src =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDirIn(dir1.path()));
+  auto const other =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDirIn(dir1.path()));
+  auto const other_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", other.path(), "tmpfs", 0, "mode=0777", 0));
+
+  auto const bind_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount(src.path(), dir2.path(), "", MS_BIND | MS_REC, "", 0));
+
+  std::vector<ProcMountInfoEntry> mounts =
+      ASSERT_NO_ERRNO_AND_VALUE(ProcSelfMountInfoEntries());
+  uint64_t bind_id = 0;
+  for (const auto& e : mounts) {
+    if (e.mount_point == dir2.path()) {
+      bind_id = e.id;
+    }
+  }
+  ASSERT_NE(bind_id, 0);
+  for (const auto& e : mounts) {
+    EXPECT_NE(e.parent_id, bind_id) << e.mount_point;
+  }
+}
+
+TEST(MountTest, BindRemountReadOnly) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir1 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const dir2 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const tmpfs_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir1.path(), "tmpfs", 0, "mode=0777", 0));
+  auto const bind_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount(dir1.path(), dir2.path(), "", MS_BIND, "", 0));
+
+  ASSERT_THAT(mount(dir1.path().c_str(), dir2.path().c_str(), "",
+                    MS_REMOUNT | MS_BIND | MS_RDONLY, nullptr),
+              SyscallSucceeds());
+
+  // Only the bind mount is read-only.
+  EXPECT_THAT(
+      open(JoinPath(dir2.path(), "foo").c_str(), O_CREAT | O_RDWR, 0777),
+      SyscallFailsWithErrno(EROFS));
+  ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(dir1.path(), "foo"), O_CREAT | O_RDWR, 0777));
+
+  const std::vector<ProcMountInfoEntry> mounts =
+      ASSERT_NO_ERRNO_AND_VALUE(ProcSelfMountInfoEntries());
+  for (const auto& e : mounts) {
+    if (e.mount_point == dir1.path()) {
+      EXPECT_TRUE(absl::StartsWith(e.mount_opts, "rw"));
+    }
+    if (e.mount_point == dir2.path()) {
+      EXPECT_TRUE(absl::StartsWith(e.mount_opts, "ro"));
+    }
+  }
+}
+
+TEST(MountTest, UmountBindRestoresMountPoint) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir1 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const dir2 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(dir1.path(), "foo"), O_CREAT | O_RDWR, 0777));
+  ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(dir2.path(), "bar"), O_CREAT | O_RDWR, 0777));
+
+  ASSERT_THAT(mount(dir1.path().c_str(), dir2.path().c_str(), "", MS_BIND,
+                    nullptr),
+              SyscallSucceeds());
+  ASSERT_NO_ERRNO(DirContains(dir2.path(), {"foo"}, {"bar"}));
+
+  ASSERT_THAT(umount2(dir2.path().c_str(), 0), SyscallSucceeds());
+  ASSERT_NO_ERRNO(DirContains(dir2.path(), {"bar"}, {"foo"}));
+}
+
+TEST(MountTest, OpenTreeCloneMoveMount) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir1 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const dir2 = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const tmpfs_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir1.path(), "tmpfs", 0, "mode=0777", 0));
+  ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(dir1.path(), "foo"), O_CREAT | O_RDWR, 0777));
+
+  int tree_fd;
+  ASSERT_THAT(tree_fd = syscall(SYS_open_tree, AT_FDCWD, dir1.path().c_str(),
+                                kOpenTreeClone | O_CLOEXEC),
+              SyscallSucceeds());
+  FileDescriptor tree(tree_fd);
+
+  // The detached tree isn't visible until it is attached.
+  ASSERT_NO_ERRNO(DirContains(dir2.path(), {}, {"foo"}));
+  ASSERT_THAT(syscall(SYS_move_mount, tree.get(), "", AT_FDCWD,
+                      dir2.path().c_str(), kMoveMountFEmptyPath),
+              SyscallSucceeds());
+  ASSERT_NO_ERRNO(DirContains(dir2.path(), {"foo"}, {}));
+
+  // Closing the file descriptor doesn't unmount an attached tree.
+  tree.reset();
+  ASSERT_NO_ERRNO(DirContains(dir2.path(), {"foo"}, {}));
+  ASSERT_THAT(umount2(dir2.path().c_str(), 0), SyscallSucceeds());
+}
+
+TEST(MountTest, OpenTreeCloneDissolvedOnClose) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const tmpfs_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", 0, "mode=0777", 0));
+
+  int tree_fd;
+  ASSERT_THAT(tree_fd = syscall(SYS_open_tree, AT_FDCWD, dir.path().c_str(),
+                                kOpenTreeClone | O_CLOEXEC),
+              SyscallSucceeds());
+  ASSERT_THAT(close(tree_fd), SyscallSucceeds());
+
+  // Only the original mount is left, so it isn't busy.
+  EXPECT_THAT(umount2(dir.path().c_str(), 0), SyscallSucceeds());
+}
+
+TEST(MountTest, MountSetattrReadOnlyInMountInfo) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const tmpfs_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", 0, "mode=0777", 0));
+
+  MountAttr attr = {};
+  attr.attr_set = kMountAttrRdonly | kMountAttrNoexec;
+  ASSERT_THAT(syscall(SYS_mount_setattr, AT_FDCWD, dir.path().c_str(),
+                      kAtRecursive, &attr, sizeof(attr)),
+              SyscallSucceeds());
+  EXPECT_THAT(
+      open(JoinPath(dir.path(), "foo").c_str(), O_CREAT | O_RDWR, 0777),
+      SyscallFailsWithErrno(EROFS));
+
+  const std::vector<ProcMountInfoEntry> mounts =
+      ASSERT_NO_ERRNO_AND_VALUE(ProcSelfMountInfoEntries());
+  for (const auto& e : mounts) {
+    if (e.mount_point == dir.path()) {
+      EXPECT_TRUE(absl::StartsWith(e.mount_opts, "ro"));
+      EXPECT_THAT(e.mount_opts, HasSubstr("noexec"));
+    }
+  }
+
+  attr = {};
+  attr.attr_clr = kMountAttrRdonly;
+  ASSERT_THAT(syscall(SYS_mount_setattr, AT_FDCWD, dir.path().c_str(), 0,
+                      &attr, sizeof(attr)),
+              SyscallSucceeds());
+  ASSERT_NO_ERRNO_AND_VALUE(
+      Open(JoinPath(dir.path(), "foo"), O_CREAT | O_RDWR, 0777));
+}
+
+TEST(MountTest, MountSetattrInvalid) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const tmpfs_mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", 0, "mode=0777", 0));
+
+  MountAttr attr = {};
+  attr.attr_set = kMountAttrRdonly;
+  // Too small.
+  EXPECT_THAT(syscall(SYS_mount_setattr, AT_FDCWD, dir.path().c_str(), 0,
+                      &attr, sizeof(attr) - 1),
+              SyscallFailsWithErrno(EINVAL));
+  // Not the root of a mount.
+  auto const subdir =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDirIn(dir.path()));
+  EXPECT_THAT(syscall(SYS_mount_setattr, AT_FDCWD, subdir.path().c_str(), 0,
+                      &attr, sizeof(attr)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MountTest, FsmountTmpfs) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+
+  int fs_fd;
+  ASSERT_THAT(fs_fd = syscall(SYS_fsopen, "tmpfs", 0), SyscallSucceeds());
+  FileDescriptor fs(fs_fd);
+  ASSERT_THAT(syscall(SYS_fsconfig, fs.get(), kFsconfigSetString, "mode",
+                      "0700", 0),
+              SyscallSucceeds());
+  ASSERT_THAT(
+      syscall(SYS_fsconfig, fs.get(), kFsconfigCmdCreate, nullptr, nullptr, 0),
+      SyscallSucceeds());
+  // Options can't be changed once the filesystem is created.
+  EXPECT_THAT(syscall(SYS_fsconfig, fs.get(), kFsconfigSetString, "mode",
+                      "0777", 0),
+              SyscallFailsWithErrno(EBUSY));
+
+  int mnt_fd;
+  ASSERT_THAT(mnt_fd = syscall(SYS_fsmount, fs.get(), 0, 0),
+              SyscallSucceeds());
+  FileDescriptor mnt(mnt_fd);
+  ASSERT_THAT(syscall(SYS_move_mount, mnt.get(), "", AT_FDCWD,
+                      dir.path().c_str(), kMoveMountFEmptyPath),
+              SyscallSucceeds());
+
+  struct stat st;
+  ASSERT_THAT(stat(dir.path().c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_mode & 0777, 0700);
+  ASSERT_THAT(umount2(dir.path().c_str(), 0), SyscallSucceeds());
+}
+
+TEST(MountTest, FsopenUnsupportedFilesystem) {
+  SKIP_IF(!IsRunningOnGvisor());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  EXPECT_THAT(syscall(SYS_fsopen, "overlay", 0),
+              SyscallFailsWithErrno(ENODEV));
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -15,19 +15,27 @@
 #include <fcntl.h>
 #include <mqueue.h>
 #include <sched.h>
+#include <signal.h>
 #include <sys/poll.h>
 #include <sys/stat.h>
+#include <sys/wait.h>
+#include <time.h>
 #include <unistd.h>
 
 #include <string>
 
+#include "absl/strings/numbers.h"
+#include "absl/time/clock.h"
+#include "absl/time/time.h"
 #include "test/util/capability_util.h"
 #include "test/util/cleanup.h"
 #include "test/util/fs_util.h"
 #include "test/util/mount_util.h"
 #include "test/util/posix_error.h"
+#include "test/util/signal_util.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
+#include "test/util/thread_util.h"
 
 #define NAME_MAX 255
 
@@ -365,6 +373,295 @@ TEST(MqTest, PollEmpty) {
   ASSERT_EQ(pfd.revents, POLLOUT | POLLWRNORM);
 }
 
+// MqAttr returns a struct mq_attr with the given limits.
+struct mq_attr MqAttr(long maxmsg, long msgsize) {
+  struct mq_attr attr = {};
+  attr.mq_maxmsg = maxmsg;
+  attr.mq_msgsize = msgsize;
+  return attr;
+}
+
+// Test sending and receiving a message.
+TEST(MqTest, SendReceive) {
+  struct mq_attr attr = MqAttr(10, 64);
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, &attr));
+
+  const std::string msg = "hello";
+  ASSERT_THAT(mq_send(queue.fd(), msg.c_str(), msg.size(), 3),
+              SyscallSucceeds());
+
+  char buf[64];
+  unsigned int prio = 0;
+  ASSERT_THAT(mq_receive(queue.fd(), buf, sizeof(buf), &prio),
+              SyscallSucceedsWithValue(msg.size()));
+  EXPECT_EQ(std::string(buf, msg.size()), msg);
+  EXPECT_EQ(prio, 3);
+}
+
+// Test that messages are received in decreasing order of priority, and in
+// send order for equal priorities.
+TEST(MqTest, ReceivePriorityOrder) {
+  struct mq_attr attr = MqAttr(10, 64);
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, &attr));
+
+  ASSERT_THAT(mq_send(queue.fd(), "a", 1, 1), SyscallSucceeds());
+  ASSERT_THAT(mq_send(queue.fd(), "b", 1, 5), SyscallSucceeds());
+  ASSERT_THAT(mq_send(queue.fd(), "c", 1, 1), SyscallSucceeds());
+  ASSERT_THAT(mq_send(queue.fd(), "d", 1, 0), SyscallSucceeds());
+
+  for (const char* want : {"b", "a", "c", "d"}) {
+    char buf[64];
+    ASSERT_THAT(mq_receive(queue.fd(), buf, sizeof(buf), nullptr),
+                SyscallSucceedsWithValue(1));
+    EXPECT_EQ(buf[0], want[0]);
+  }
+}
+
+// Test the size and priority limits of mq_send and mq_receive.
+TEST(MqTest, SendReceiveInvalidArgs) {
+  struct mq_attr attr = MqAttr(10, 64);
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, &attr));
+
+  char buf[65] = {};
+  EXPECT_THAT(mq_send(queue.fd(), buf, sizeof(buf), 0),
+              SyscallFailsWithErrno(EMSGSIZE));
+  EXPECT_THAT(mq_send(queue.fd(), buf, 1, MQ_PRIO_MAX),
+              SyscallFailsWithErrno(EINVAL));
+
+  ASSERT_THAT(mq_send(queue.fd(), buf, 1, 0), SyscallSucceeds());
+  // The buffer must be able to hold a message of the maximum size.
+  EXPECT_THAT(mq_receive(queue.fd(), buf, 63, nullptr),
+              SyscallFailsWithErrno(EMSGSIZE));
+}
+
+// Test that mq_send and mq_receive require write and read access.
+TEST(MqTest, SendReceiveAccess) {
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDONLY | O_CREAT | O_EXCL, 0777, nullptr));
+  EXPECT_THAT(mq_send(queue.fd(), "a", 1, 0), SyscallFailsWithErrno(EBADF));
+
+  mqd_t wfd;
+  ASSERT_THAT(wfd = mq_open(queue.name(), O_WRONLY), SyscallSucceeds());
+  auto cleanup =
+      Cleanup([wfd] { EXPECT_THAT(mq_close(wfd), SyscallSucceeds()); });
+  char buf[8192];
+  EXPECT_THAT(mq_receive(wfd, buf, sizeof(buf), nullptr),
+              SyscallFailsWithErrno(EBADF));
+
+  // Regular files are not message queues.
+  EXPECT_THAT(mq_send(STDIN_FILENO, "a", 1, 0), SyscallFailsWithErrno(EBADF));
+}
+
+// Test O_NONBLOCK on empty and full queues.
+TEST(MqTest, NonBlocking) {
+  struct mq_attr attr = MqAttr(1, 64);
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL | O_NONBLOCK, 0777, &attr));
+
+  char buf[64];
+  EXPECT_THAT(mq_receive(queue.fd(), buf, sizeof(buf), nullptr),
+              SyscallFailsWithErrno(EAGAIN));
+  ASSERT_THAT(mq_send(queue.fd(), "a", 1, 0), SyscallSucceeds());
+  EXPECT_THAT(mq_send(queue.fd(), "b", 1, 0), SyscallFailsWithErrno(EAGAIN));
+}
+
+// Test that mq_timedsend and mq_timedreceive time out at an absolute
+// deadline.
+TEST(MqTest, TimedSendReceiveTimeout) {
+  struct mq_attr attr = MqAttr(1, 64);
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, &attr));
+
+  char buf[64];
+  const absl::Duration timeout = absl::Milliseconds(100);
+  absl::Time start = absl::Now();
+  struct timespec deadline = absl::ToTimespec(start + timeout);
+  EXPECT_THAT(mq_timedreceive(queue.fd(), buf, sizeof(buf), nullptr, &deadline),
+              SyscallFailsWithErrno(ETIMEDOUT));
+  EXPECT_GE(absl::Now() - start, timeout);
+
+  ASSERT_THAT(mq_send(queue.fd(), "a", 1, 0), SyscallSucceeds());
+  start = absl::Now();
+  deadline = absl::ToTimespec(start + timeout);
+  EXPECT_THAT(mq_timedsend(queue.fd(), "b", 1, 0, &deadline),
+              SyscallFailsWithErrno(ETIMEDOUT));
+  EXPECT_GE(absl::Now() - start, timeout);
+
+  // Invalid timeouts are rejected even if the call wouldn't block.
+  struct timespec invalid = {.tv_sec = 0, .tv_nsec = 1000000000};
+  EXPECT_THAT(mq_timedreceive(queue.fd(), buf, sizeof(buf), nullptr, &invalid),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// Test that a blocked mq_receive is woken by mq_send.
+TEST(MqTest, BlockingReceive) {
+  struct mq_attr attr = MqAttr(10, 64);
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, &attr));
+  mqd_t fd = queue.fd();
+
+  ScopedThread t([fd] {
+    absl::SleepFor(absl::Milliseconds(100));
+    TEST_PCHECK(mq_send(fd, "hello", 5, 0) == 0);
+  });
+
+  char buf[64];
+  ASSERT_THAT(mq_receive(fd, buf, sizeof(buf), nullptr),
+              SyscallSucceedsWithValue(5));
+  EXPECT_EQ(std::string(buf, 5), "hello");
+}
+
+// Test mq_getsetattr(2).
+TEST(MqTest, GetSetAttr) {
+  struct mq_attr attr = MqAttr(4, 64);
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, &attr));
+  ASSERT_THAT(mq_send(queue.fd(), "a", 1, 0), SyscallSucceeds());
+
+  struct mq_attr got = {};
+  ASSERT_THAT(mq_getattr(queue.fd(), &got), SyscallSucceeds());
+  EXPECT_EQ(got.mq_flags, 0);
+  EXPECT_EQ(got.mq_maxmsg, 4);
+  EXPECT_EQ(got.mq_msgsize, 64);
+  EXPECT_EQ(got.mq_curmsgs, 1);
+
+  // Only O_NONBLOCK can be changed.
+  struct mq_attr set = MqAttr(1, 1);
+  set.mq_flags = O_NONBLOCK;
+  ASSERT_THAT(mq_setattr(queue.fd(), &set, &got), SyscallSucceeds());
+  EXPECT_EQ(got.mq_flags, 0);
+  ASSERT_THAT(mq_getattr(queue.fd(), &got), SyscallSucceeds());
+  EXPECT_EQ(got.mq_flags, O_NONBLOCK);
+  EXPECT_EQ(got.mq_maxmsg, 4);
+  EXPECT_EQ(got.mq_msgsize, 64);
+
+  char buf[64];
+  ASSERT_THAT(mq_receive(queue.fd(), buf, sizeof(buf), nullptr),
+              SyscallSucceeds());
+  EXPECT_THAT(mq_receive(queue.fd(), buf, sizeof(buf), nullptr),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+// Test mq_notify(3) with SIGEV_SIGNAL.
+TEST(MqTest, NotifySignal) {
+  struct mq_attr attr = MqAttr(10, 64);
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, &attr));
+
+  auto mask = ASSERT_NO_ERRNO_AND_VALUE(ScopedSignalMask(SIG_BLOCK, SIGUSR1));
+
+  struct sigevent sev = {};
+  sev.sigev_notify = SIGEV_SIGNAL;
+  sev.sigev_signo = SIGUSR1;
+  sev.sigev_value.sival_int = 42;
+  ASSERT_THAT(mq_notify(queue.fd(), &sev), SyscallSucceeds());
+  // Only one process can be registered.
+  EXPECT_THAT(mq_notify(queue.fd(), &sev), SyscallFailsWithErrno(EBUSY));
+
+  ASSERT_THAT(mq_send(queue.fd(), "a", 1, 0), SyscallSucceeds());
+
+  sigset_t set;
+  sigemptyset(&set);
+  sigaddset(&set, SIGUSR1);
+  siginfo_t info = {};
+  struct timespec timeout = absl::ToTimespec(absl::Seconds(10));
+  ASSERT_THAT(sigtimedwait(&set, &info, &timeout),
+              SyscallSucceedsWithValue(SIGUSR1));
+  EXPECT_EQ(info.si_code, SI_MESGQ);
+  EXPECT_EQ(info.si_value.sival_int, 42);
+  EXPECT_EQ(info.si_pid, getpid());
+
+  // The registration was removed by the notification.
+  ASSERT_THAT(mq_notify(queue.fd(), &sev), SyscallSucceeds());
+  ASSERT_THAT(mq_notify(queue.fd(), nullptr), SyscallSucceeds());
+}
+
+// Test that notification only occurs when a message arrives in an empty
+// queue.
+TEST(MqTest, NotifyNonEmpty) {
+  struct mq_attr attr = MqAttr(10, 64);
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, &attr));
+  ASSERT_THAT(mq_send(queue.fd(), "a", 1, 0), SyscallSucceeds());
+
+  auto mask = ASSERT_NO_ERRNO_AND_VALUE(ScopedSignalMask(SIG_BLOCK, SIGUSR1));
+
+  struct sigevent sev = {};
+  sev.sigev_notify = SIGEV_SIGNAL;
+  sev.sigev_signo = SIGUSR1;
+  ASSERT_THAT(mq_notify(queue.fd(), &sev), SyscallSucceeds());
+  ASSERT_THAT(mq_send(queue.fd(), "b", 1, 0), SyscallSucceeds());
+
+  sigset_t set;
+  sigemptyset(&set);
+  sigaddset(&set, SIGUSR1);
+  struct timespec timeout = absl::ToTimespec(absl::Milliseconds(100));
+  EXPECT_THAT(sigtimedwait(&set, nullptr, &timeout),
+              SyscallFailsWithErrno(EAGAIN));
+
+  // The registration is still in effect.
+  EXPECT_THAT(mq_notify(queue.fd(), &sev), SyscallFailsWithErrno(EBUSY));
+  ASSERT_THAT(mq_notify(queue.fd(), nullptr), SyscallSucceeds());
+}
+
+// Test that another process can't register while a process is registered.
+TEST(MqTest, NotifyOtherProcessBusy) {
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, nullptr));
+
+  struct sigevent sev = {};
+  sev.sigev_notify = SIGEV_NONE;
+  ASSERT_THAT(mq_notify(queue.fd(), &sev), SyscallSucceeds());
+
+  const mqd_t fd = queue.fd();
+  pid_t child = fork();
+  if (child == 0) {
+    TEST_CHECK(mq_notify(fd, &sev) == -1 && errno == EBUSY);
+    // Unregistering from a process that isn't registered has no effect.
+    TEST_PCHECK(mq_notify(fd, nullptr) == 0);
+    TEST_CHECK(mq_notify(fd, &sev) == -1 && errno == EBUSY);
+    _exit(0);
+  }
+  ASSERT_THAT(child, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child, &status, 0),
+              SyscallSucceedsWithValue(child));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status = " << status;
+}
+
+// Test reading the state of the queue after sending a message.
+TEST(MqTest, ReadAfterSend) {
+  PosixQueue queue = ASSERT_NO_ERRNO_AND_VALUE(
+      MqOpen(O_RDWR | O_CREAT | O_EXCL, 0777, nullptr));
+  ASSERT_THAT(mq_send(queue.fd(), "hello", 5, 0), SyscallSucceeds());
+
+  const size_t msgSize = 60;
+  char queueRead[msgSize];
+  queueRead[msgSize - 1] = '\0';
+  ASSERT_THAT(read(queue.fd(), &queueRead[0], msgSize - 1), SyscallSucceeds());
+
+  std::string want(
+      "QSIZE:5          NOTIFY:0     SIGNO:0     NOTIFY_PID:0     ");
+  std::string got(queueRead);
+  EXPECT_EQ(got, want);
+}
+
+// Test that the queue limits are exposed in /proc/sys/fs/mqueue.
+TEST(MqTest, ProcSysLimits) {
+  for (const char* name : {"msg_default", "msg_max", "msgsize_default",
+                           "msgsize_max", "queues_max"}) {
+    std::string contents = ASSERT_NO_ERRNO_AND_VALUE(
+        GetContents(JoinPath("/proc/sys/fs/mqueue", name)));
+    int value;
+    ASSERT_TRUE(absl::SimpleAtoi(contents, &value)) << name << ": " << contents;
+    EXPECT_GT(value, 0) << name;
+  }
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -18,9 +18,16 @@
 #include <sys/msg.h>
 #include <sys/types.h>
 
+#include <string>
+#include <vector>
+
+#include "gmock/gmock.h"
+#include "absl/strings/str_cat.h"
+#include "absl/strings/str_split.h"
 #include "absl/synchronization/notification.h"
 #include "absl/time/clock.h"
 #include "test/util/capability_util.h"
+#include "test/util/fs_util.h"
 #include "test/util/signal_util.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
@@ -30,6 +37,8 @@ namespace gvisor {
 namespace testing {
 namespace {
 
+using ::testing::HasSubstr;
+
 // Source: include/uapi/linux/msg.h
 constexpr int msgMnb = 16384;  // Maximum number of bytes in a queue.
 constexpr int msgMni = 32000;  // Max number of identifiers.
@@ -868,6 +877,82 @@ TEST(MsgqueueTest, MsgCtlMsgInfo) {
   EXPECT_EQ(info.msgssz, msgSsz);
 }
 
+#ifndef MSG_STAT_ANY
+#define MSG_STAT_ANY 13
+#endif  // MSG_STAT_ANY
+
+// Test msgctl with MSG_STAT and MSG_STAT_ANY options.
+TEST(MsgqueueTest, MsgCtlMsgStat) {
+  // Drop CAP_IPC_OWNER which allows us to bypass queue permissions.
+  AutoCapability cap(CAP_IPC_OWNER, false);
+  Queue queue(msgget(IPC_PRIVATE, 0600));
+  ASSERT_THAT(queue.get(), SyscallSucceeds());
+
+  struct msginfo info;
+  int max_used_index;
+  ASSERT_THAT(max_used_index = msgctl(
+                  0, MSG_INFO, reinterpret_cast<struct msqid_ds*>(&info)),
+              SyscallSucceeds());
+
+  bool found = false;
+  for (int i = 0; i <= max_used_index; i++) {
+    struct msqid_ds ds = {};
+    if (msgctl(i, MSG_STAT, &ds) != queue.get()) {
+      continue;
+    }
+    found = true;
+    EXPECT_EQ(ds.msg_perm.mode, 0600);
+
+    // Remove the queue's read permission, but keep the write permission so
+    // that it can be removed.
+    struct msqid_ds set_ds = ds;
+    set_ds.msg_perm.mode = 0200;
+    ASSERT_THAT(msgctl(queue.get(), IPC_SET, &set_ds), SyscallSucceeds());
+    EXPECT_THAT(msgctl(i, MSG_STAT, &ds), SyscallFailsWithErrno(EACCES));
+    int val = msgctl(i, MSG_STAT_ANY, &ds);
+    if (val == -1) {
+      // Only if the kernel doesn't support the command MSG_STAT_ANY.
+      EXPECT_TRUE(errno == EINVAL || errno == EFAULT);
+    } else {
+      EXPECT_EQ(val, queue.get());
+      EXPECT_EQ(ds.msg_perm.mode, 0200);
+    }
+  }
+  EXPECT_TRUE(found);
+}
+
+// Test that queues are listed in /proc/sysvipc/msg.
+TEST(MsgqueueTest, ProcSysvipcMsg) {
+  Queue queue(msgget(IPC_PRIVATE, 0600));
+  ASSERT_THAT(queue.get(), SyscallSucceeds());
+
+  msgbuf buf{1, "A message."};
+  ASSERT_THAT(msgsnd(queue.get(), &buf, sizeof(buf.mtext), 0),
+              SyscallSucceeds());
+
+  const std::string contents =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sysvipc/msg"));
+  std::vector<std::string> lines = absl::StrSplit(contents, '\n');
+  ASSERT_GE(lines.size(), 1);
+  EXPECT_THAT(lines[0], HasSubstr("msqid perms"));
+
+  bool found = false;
+  for (const std::string& line : lines) {
+    std::vector<std::string> fields =
+        absl::StrSplit(line, ' ', absl::SkipEmpty());
+    // key msqid perms cbytes qnum ...
+    if (fields.size() < 5 || fields[1] != absl::StrCat(queue.get())) {
+      continue;
+    }
+    found = true;
+    EXPECT_EQ(fields[0], "0");  // IPC_PRIVATE
+    EXPECT_EQ(fields[2], "600");
+    EXPECT_EQ(fields[3], absl::StrCat(msgSize));
+    EXPECT_EQ(fields[4], "1");
+  }
+  EXPECT_TRUE(found);
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -12,9 +12,15 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <sched.h>
+#include <sys/socket.h>
+#include <sys/un.h>
+
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
 #include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
 #include "test/util/thread_util.h"
 
 namespace gvisor {
@@ -32,6 +38,46 @@ TEST(NetworkNamespaceTest, LoopbackExists) {
   });
 }
 
+// Abstract unix sockets are scoped to the network namespace.
+TEST(NetworkNamespaceTest, AbstractSocketsIsolated) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  struct sockaddr_un addr =
+      ASSERT_NO_ERRNO_AND_VALUE(UniqueUnixAddr(true, AF_UNIX));
+  const FileDescriptor bound =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+  ASSERT_THAT(bind(bound.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                   sizeof(addr)),
+              SyscallSucceeds());
+  ASSERT_THAT(listen(bound.get(), 5), SyscallSucceeds());
+
+  ScopedThread t([&] {
+    ASSERT_THAT(unshare(CLONE_NEWNET), SyscallSucceedsWithValue(0));
+
+    // The socket bound in the parent's namespace is not visible.
+    const FileDescriptor client =
+        ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+    ASSERT_THAT(connect(client.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                        sizeof(addr)),
+                SyscallFailsWithErrno(ECONNREFUSED));
+
+    // So its name can be bound again.
+    const FileDescriptor other =
+        ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+    ASSERT_THAT(bind(other.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                     sizeof(addr)),
+                SyscallSucceeds());
+  });
+  t.Join();
+
+  // The parent's namespace is unaffected.
+  const FileDescriptor client =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+  ASSERT_THAT(connect(client.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                      sizeof(addr)),
+              SyscallSucceeds());
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
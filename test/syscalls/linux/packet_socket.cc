@@ -12,10 +12,11 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <linux/if_packet.h>
 #include <net/if.h>
 #include <netinet/if_ether.h>
-#include <netpacket/packet.h>
 #include <poll.h>
+#include <sys/mman.h>
 #include <sys/socket.h>
 #include <sys/types.h>
 
@@ -24,6 +25,7 @@
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
 #include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/socket_util.h"
 
@@ -311,6 +313,120 @@ TEST_P(PacketSocketTest, RebindProtocol) {
   ASSERT_NO_FATAL_FAILURE(test_recv(counter));
 }
 
+TEST_P(PacketSocketTest, RxRingV3) {
+  constexpr int kBlockSize = 4096;
+  constexpr int kBlockNr = 4;
+  constexpr int kFrameSize = 2048;
+
+  int version = TPACKET_V3;
+  ASSERT_THAT(setsockopt(socket_.get(), SOL_PACKET, PACKET_VERSION, &version,
+                         sizeof(version)),
+              SyscallSucceeds());
+
+  tpacket_req3 req = {
+      .tp_block_size = kBlockSize,
+      .tp_block_nr = kBlockNr,
+      .tp_frame_size = kFrameSize,
+      .tp_frame_nr = kBlockSize / kFrameSize * kBlockNr,
+      .tp_retire_blk_tov = 10,
+  };
+  ASSERT_THAT(
+      setsockopt(socket_.get(), SOL_PACKET, PACKET_RX_RING, &req, sizeof(req)),
+      SyscallSucceeds());
+
+  // The version can't be changed while a ring is configured.
+  EXPECT_THAT(setsockopt(socket_.get(), SOL_PACKET, PACKET_VERSION, &version,
+                         sizeof(version)),
+              SyscallFailsWithErrno(EBUSY));
+
+  constexpr size_t kRingSize = kBlockSize * kBlockNr;
+  void* ring = mmap(nullptr, kRingSize, PROT_READ | PROT_WRITE, MAP_SHARED,
+                    socket_.get(), 0);
+  ASSERT_NE(ring, MAP_FAILED);
+  const auto unmap = Cleanup([&] { munmap(ring, kRingSize); });
+
+  // The ring can't be replaced while it is mapped.
+  EXPECT_THAT(
+      setsockopt(socket_.get(), SOL_PACKET, PACKET_RX_RING, &req, sizeof(req)),
+      SyscallFailsWithErrno(EBUSY));
+
+  const int loopback_index = ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex());
+  const sockaddr_ll packet_bind_addr = {
+      .sll_family = AF_PACKET,
+      .sll_protocol = htons(ETH_P_IP),
+      .sll_ifindex = loopback_index,
+  };
+  ASSERT_THAT(
+      bind(socket_.get(), reinterpret_cast<const sockaddr*>(&packet_bind_addr),
+           sizeof(packet_bind_addr)),
+      SyscallSucceeds());
+
+  sockaddr_in udp_addr = {
+      .sin_family = AF_INET,
+      .sin_addr = {.s_addr = htonl(INADDR_LOOPBACK)},
+  };
+  FileDescriptor udp_sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_DGRAM, 0));
+  ASSERT_THAT(bind(udp_sock.get(), reinterpret_cast<const sockaddr*>(&udp_addr),
+                   sizeof(udp_addr)),
+              SyscallSucceeds());
+  socklen_t addrlen = sizeof(udp_addr);
+  ASSERT_THAT(getsockname(udp_sock.get(),
+                          reinterpret_cast<sockaddr*>(&udp_addr), &addrlen),
+              SyscallSucceeds());
+
+  constexpr uint64_t kPayload = 0xfeedfacecafef00d;
+  ASSERT_THAT(sendto(udp_sock.get(), &kPayload, sizeof(kPayload), 0,
+                     reinterpret_cast<const sockaddr*>(&udp_addr),
+                     sizeof(udp_addr)),
+              SyscallSucceeds());
+
+  // The block is retired to us when its timeout expires.
+  pollfd pfd = {.fd = socket_.get(), .events = POLLIN};
+  ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, 1000), SyscallSucceedsWithValue(1));
+
+  auto* block = static_cast<tpacket_block_desc*>(ring);
+  ASSERT_TRUE(block->hdr.bh1.block_status & TP_STATUS_USER);
+  ASSERT_GE(block->hdr.bh1.num_pkts, 1);
+
+  auto* hdr = reinterpret_cast<tpacket3_hdr*>(
+      static_cast<char*>(ring) + block->hdr.bh1.offset_to_first_pkt);
+  auto* sll = reinterpret_cast<sockaddr_ll*>(reinterpret_cast<char*>(hdr) +
+                                             TPACKET_ALIGN(sizeof(*hdr)));
+  EXPECT_EQ(sll->sll_family, AF_PACKET);
+  EXPECT_EQ(sll->sll_ifindex, loopback_index);
+  EXPECT_EQ(ntohs(sll->sll_protocol), ETH_P_IP);
+
+  constexpr size_t kIPPacketLen =
+      sizeof(iphdr) + sizeof(udphdr) + sizeof(kPayload);
+  EXPECT_EQ(hdr->tp_snaplen, hdr->tp_len);
+  if (GetParam() == SOCK_RAW) {
+    EXPECT_EQ(hdr->tp_len, sizeof(ethhdr) + kIPPacketLen);
+    EXPECT_EQ(hdr->tp_net - hdr->tp_mac, sizeof(ethhdr));
+  } else {
+    EXPECT_EQ(hdr->tp_len, kIPPacketLen);
+    EXPECT_EQ(hdr->tp_net, hdr->tp_mac);
+  }
+  uint64_t payload;
+  memcpy(&payload,
+         reinterpret_cast<char*>(hdr) + hdr->tp_net + sizeof(iphdr) +
+             sizeof(udphdr),
+         sizeof(payload));
+  EXPECT_EQ(payload, kPayload);
+
+  // Return the block to the kernel.
+  block->hdr.bh1.block_status = TP_STATUS_KERNEL;
+
+  tpacket_stats_v3 stats = {};
+  socklen_t stats_len = sizeof(stats);
+  ASSERT_THAT(getsockopt(socket_.get(), SOL_PACKET, PACKET_STATISTICS, &stats,
+                         &stats_len),
+              SyscallSucceeds());
+  EXPECT_EQ(stats_len, sizeof(stats));
+  EXPECT_GE(stats.tp_packets, 1);
+  EXPECT_EQ(stats.tp_drops, 0);
+}
+
 INSTANTIATE_TEST_SUITE_P(AllPacketSocketTests, PacketSocketTest,
                          Values(SOCK_DGRAM, SOCK_RAW));
 
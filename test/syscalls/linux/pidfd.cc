@@ -0,0 +1,332 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <fcntl.h>
+#include <linux/sched.h>
+#include <poll.h>
+#include <signal.h>
+#include <sys/stat.h>
+#include <sys/syscall.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "gtest/gtest.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/posix_error.h"
+#include "test/util/test_util.h"
+#include "test/util/thread_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+#if defined(__x86_64__) || defined(__aarch64__)
+#ifndef SYS_pidfd_send_signal
+#define SYS_pidfd_send_signal 424
+#endif
+#ifndef SYS_pidfd_open
+#define SYS_pidfd_open 434
+#endif
+#ifndef SYS_clone3
+#define SYS_clone3 435
+#endif
+#ifndef SYS_pidfd_getfd
+#define SYS_pidfd_getfd 438
+#endif
+#else
+#error "Unknown architecture"
+#endif
+
+#ifndef P_PIDFD
+#define P_PIDFD 3
+#endif
+
+#ifndef PIDFD_NONBLOCK
+#define PIDFD_NONBLOCK O_NONBLOCK
+#endif
+
+#ifndef CLONE_PIDFD
+#define CLONE_PIDFD 0x1000
+#endif
+
+int pidfd_open(pid_t pid, unsigned int flags) {
+  return syscall(SYS_pidfd_open, pid, flags);
+}
+
+int pidfd_send_signal(int pidfd, int sig, siginfo_t* info,
+                      unsigned int flags) {
+  return syscall(SYS_pidfd_send_signal, pidfd, sig, info, flags);
+}
+
+int pidfd_getfd(int pidfd, int targetfd, unsigned int flags) {
+  return syscall(SYS_pidfd_getfd, pidfd, targetfd, flags);
+}
+
+// PidfdOpen returns a pidfd referring to pid.
+PosixErrorOr<FileDescriptor> PidfdOpen(pid_t pid) {
+  int fd = pidfd_open(pid, 0);
+  MaybeSave();
+  if (fd < 0) {
+    return PosixError(errno, "pidfd_open");
+  }
+  return FileDescriptor(fd);
+}
+
+// ForkBlocked forks a child that blocks until it's killed.
+PosixErrorOr<pid_t> ForkBlocked() {
+  pid_t pid = fork();
+  if (pid == 0) {
+    while (true) {
+      pause();
+    }
+  }
+  if (pid < 0) {
+    return PosixError(errno, "fork");
+  }
+  return pid;
+}
+
+// ForkExit forks a child that exits immediately with the given status.
+PosixErrorOr<pid_t> ForkExit(int status) {
+  pid_t pid = fork();
+  if (pid == 0) {
+    _exit(status);
+  }
+  if (pid < 0) {
+    return PosixError(errno, "fork");
+  }
+  return pid;
+}
+
+TEST(PidfdTest, OpenInvalid) {
+  EXPECT_THAT(pidfd_open(getpid(), O_CLOEXEC), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(pidfd_open(0, 0), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(pidfd_open(-1, 0), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(PidfdTest, OpenNonLeader) {
+  ScopedThread t([&] {
+    EXPECT_THAT(pidfd_open(gettid(), 0), SyscallFailsWithErrno(EINVAL));
+  });
+}
+
+TEST(PidfdTest, OpenIsCloexec) {
+  FileDescriptor pidfd =
+      ASSERT_NO_ERRNO_AND_VALUE(PidfdOpen(getpid()));
+  EXPECT_THAT(fcntl(pidfd.get(), F_GETFD),
+              SyscallSucceedsWithValue(FD_CLOEXEC));
+}
+
+TEST(PidfdTest, ReadableOnExit) {
+  pid_t pid = ASSERT_NO_ERRNO_AND_VALUE(ForkBlocked());
+  int fd;
+  ASSERT_THAT(fd = pidfd_open(pid, 0), SyscallSucceeds());
+  FileDescriptor pidfd(fd);
+
+  struct pollfd pfd = {.fd = pidfd.get(), .events = POLLIN};
+  EXPECT_THAT(poll(&pfd, 1, 0), SyscallSucceedsWithValue(0));
+
+  ASSERT_THAT(kill(pid, SIGKILL), SyscallSucceeds());
+  EXPECT_THAT(poll(&pfd, 1, -1), SyscallSucceedsWithValue(1));
+  EXPECT_EQ(pfd.revents & POLLIN, POLLIN);
+
+  siginfo_t info = {};
+  ASSERT_THAT(waitid(static_cast<idtype_t>(P_PIDFD), pidfd.get(), &info,
+                     WEXITED),
+              SyscallSucceeds());
+  EXPECT_EQ(info.si_pid, pid);
+  EXPECT_EQ(info.si_code, CLD_KILLED);
+  EXPECT_EQ(info.si_status, SIGKILL);
+}
+
+TEST(PidfdTest, SendSignal) {
+  pid_t pid = ASSERT_NO_ERRNO_AND_VALUE(ForkBlocked());
+  int fd;
+  ASSERT_THAT(fd = pidfd_open(pid, 0), SyscallSucceeds());
+  FileDescriptor pidfd(fd);
+
+  EXPECT_THAT(pidfd_send_signal(pidfd.get(), SIGKILL, nullptr, 1),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(pidfd_send_signal(pidfd.get(), 0, nullptr, 0),
+              SyscallSucceeds());
+
+  // Only the kernel and the process itself can use positive si_codes.
+  siginfo_t info = {};
+  info.si_signo = SIGKILL;
+  info.si_code = SI_USER;
+  EXPECT_THAT(pidfd_send_signal(pidfd.get(), SIGKILL, &info, 0),
+              SyscallFailsWithErrno(EPERM));
+  info.si_code = SI_QUEUE;
+  EXPECT_THAT(pidfd_send_signal(pidfd.get(), SIGTERM, &info, 0),
+              SyscallFailsWithErrno(EINVAL));
+  ASSERT_THAT(pidfd_send_signal(pidfd.get(), SIGKILL, &info, 0),
+              SyscallSucceeds());
+
+  int status;
+  ASSERT_THAT(waitpid(pid, &status, 0), SyscallSucceedsWithValue(pid));
+  EXPECT_TRUE(WIFSIGNALED(status) && WTERMSIG(status) == SIGKILL)
+      << "status = " << status;
+}
+
+TEST(PidfdTest, SendSignalNotPidfd) {
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+  EXPECT_THAT(pidfd_send_signal(fd.get(), 0, nullptr, 0),
+              SyscallFailsWithErrno(EBADF));
+}
+
+TEST(PidfdTest, RemainsValidAfterReap) {
+  pid_t pid = ASSERT_NO_ERRNO_AND_VALUE(ForkExit(0));
+  int fd;
+  ASSERT_THAT(fd = pidfd_open(pid, 0), SyscallSucceeds());
+  FileDescriptor pidfd(fd);
+
+  int status;
+  ASSERT_THAT(waitpid(pid, &status, 0), SyscallSucceedsWithValue(pid));
+
+  struct pollfd pfd = {.fd = pidfd.get(), .events = POLLIN};
+  EXPECT_THAT(poll(&pfd, 1, 0), SyscallSucceedsWithValue(1));
+  EXPECT_EQ(pfd.revents & (POLLIN | POLLHUP), POLLIN | POLLHUP);
+
+  EXPECT_THAT(pidfd_send_signal(pidfd.get(), SIGKILL, nullptr, 0),
+              SyscallFailsWithErrno(ESRCH));
+  siginfo_t info = {};
+  EXPECT_THAT(waitid(static_cast<idtype_t>(P_PIDFD), pidfd.get(), &info,
+                     WEXITED),
+              SyscallFailsWithErrno(ECHILD));
+  EXPECT_THAT(pidfd_getfd(pidfd.get(), 0, 0), SyscallFailsWithErrno(ESRCH));
+}
+
+TEST(PidfdTest, WaitidNonblocking) {
+  pid_t pid = ASSERT_NO_ERRNO_AND_VALUE(ForkBlocked());
+  int fd;
+  ASSERT_THAT(fd = pidfd_open(pid, PIDFD_NONBLOCK), SyscallSucceeds());
+  FileDescriptor pidfd(fd);
+
+  // A nonblocking pidfd implies WNOHANG.
+  siginfo_t info = {};
+  EXPECT_THAT(waitid(static_cast<idtype_t>(P_PIDFD), pidfd.get(), &info,
+                     WEXITED),
+              SyscallSucceeds());
+  EXPECT_EQ(info.si_pid, 0);
+
+  ASSERT_THAT(kill(pid, SIGKILL), SyscallSucceeds());
+  int status;
+  ASSERT_THAT(waitpid(pid, &status, 0), SyscallSucceedsWithValue(pid));
+}
+
+TEST(PidfdTest, Getfd) {
+  FileDescriptor file = ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+  FileDescriptor pidfd =
+      ASSERT_NO_ERRNO_AND_VALUE(PidfdOpen(getpid()));
+
+  EXPECT_THAT(pidfd_getfd(pidfd.get(), file.get(), 1),
+              SyscallFailsWithErrno(EINVAL));
+
+  int fd;
+  ASSERT_THAT(fd = pidfd_getfd(pidfd.get(), file.get(), 0),
+              SyscallSucceeds());
+  FileDescriptor dup(fd);
+  EXPECT_THAT(fcntl(dup.get(), F_GETFD), SyscallSucceedsWithValue(FD_CLOEXEC));
+
+  struct stat st1, st2;
+  ASSERT_THAT(fstat(file.get(), &st1), SyscallSucceeds());
+  ASSERT_THAT(fstat(dup.get(), &st2), SyscallSucceeds());
+  EXPECT_EQ(st1.st_dev, st2.st_dev);
+  EXPECT_EQ(st1.st_ino, st2.st_ino);
+
+  // The file description is shared.
+  EXPECT_THAT(fcntl(file.get(), F_SETFL, O_NONBLOCK), SyscallSucceeds());
+  int flags;
+  ASSERT_THAT(flags = fcntl(dup.get(), F_GETFL), SyscallSucceeds());
+  EXPECT_EQ(flags & O_NONBLOCK, O_NONBLOCK);
+
+  const int kBadFD = 1 << 20;
+  EXPECT_THAT(pidfd_getfd(pidfd.get(), kBadFD, 0),
+              SyscallFailsWithErrno(EBADF));
+}
+
+TEST(PidfdTest, CloneWithPidfd) {
+  int fd = -1;
+  pid_t pid = syscall(SYS_clone, CLONE_PIDFD | SIGCHLD, nullptr, &fd, nullptr,
+                      nullptr);
+  if (pid == 0) {
+    _exit(7);
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  ASSERT_GE(fd, 0);
+  FileDescriptor pidfd(fd);
+  EXPECT_THAT(fcntl(pidfd.get(), F_GETFD),
+              SyscallSucceedsWithValue(FD_CLOEXEC));
+
+  siginfo_t info = {};
+  ASSERT_THAT(waitid(static_cast<idtype_t>(P_PIDFD), pidfd.get(), &info,
+                     WEXITED),
+              SyscallSucceeds());
+  EXPECT_EQ(info.si_pid, pid);
+  EXPECT_EQ(info.si_code, CLD_EXITED);
+  EXPECT_EQ(info.si_status, 7);
+}
+
+TEST(PidfdTest, CloneWithPidfdInvalid) {
+  int fd = -1;
+  EXPECT_THAT(syscall(SYS_clone, CLONE_PIDFD | CLONE_PARENT_SETTID | SIGCHLD,
+                      nullptr, &fd, nullptr, nullptr),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(syscall(SYS_clone, CLONE_PIDFD | CLONE_DETACHED | SIGCHLD,
+                      nullptr, &fd, nullptr, nullptr),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(PidfdTest, Clone3WithPidfd) {
+  int fd = -1;
+  struct clone_args args = {};
+  args.flags = CLONE_PIDFD;
+  args.pidfd = reinterpret_cast<uint64_t>(&fd);
+  args.exit_signal = SIGCHLD;
+  pid_t pid = syscall(SYS_clone3, &args, sizeof(args));
+  if (pid == 0) {
+    _exit(7);
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  ASSERT_GE(fd, 0);
+  FileDescriptor pidfd(fd);
+
+  siginfo_t info = {};
+  ASSERT_THAT(waitid(static_cast<idtype_t>(P_PIDFD), pidfd.get(), &info,
+                     WEXITED),
+              SyscallSucceeds());
+  EXPECT_EQ(info.si_pid, pid);
+  EXPECT_EQ(info.si_code, CLD_EXITED);
+  EXPECT_EQ(info.si_status, 7);
+}
+
+TEST(PidfdTest, Clone3Invalid) {
+  struct clone_args args = {};
+  args.exit_signal = SIGCHLD;
+  EXPECT_THAT(syscall(SYS_clone3, &args, 32), SyscallFailsWithErrno(EINVAL));
+
+  args.flags = CLONE_DETACHED;
+  EXPECT_THAT(syscall(SYS_clone3, &args, sizeof(args)),
+              SyscallFailsWithErrno(EINVAL));
+
+  args.flags = CLONE_THREAD | CLONE_SIGHAND | CLONE_VM;
+  EXPECT_THAT(syscall(SYS_clone3, &args, sizeof(args)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -17,6 +17,7 @@
 #include <netinet/in.h>
 #include <netinet/ip.h>
 #include <netinet/ip_icmp.h>
+#include <poll.h>
 #include <sys/socket.h>
 #include <sys/types.h>
 #include <unistd.h>
@@ -27,10 +28,13 @@
 
 #include "gtest/gtest.h"
 #include "absl/algorithm/container.h"
+#include "absl/strings/str_cat.h"
 #include "absl/strings/str_join.h"
 #include "absl/types/optional.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
+#include "test/util/cleanup.h"
 #include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
 #include "test/util/socket_util.h"
 #include "test/util/test_util.h"
 
@@ -404,6 +408,87 @@ TEST(PingSocket, ReceiveIPv6PktInfo) {
             0);
 }
 
+TEST(PingSocket, ICMPv6FilterBlocksEchoReply) {
+  // Linux only supports ICMPV6_FILTER on raw sockets.
+  SKIP_IF(!IsRunningOnGvisor());
+
+  PosixErrorOr<FileDescriptor> result =
+      Socket(AF_INET6, SOCK_DGRAM, IPPROTO_ICMPV6);
+  if (!result.ok()) {
+    int errno_value = result.error().errno_value();
+    ASSERT_EQ(errno_value, EACCES) << strerror(errno_value);
+    GTEST_SKIP() << "ping socket not supported";
+  }
+  FileDescriptor& ping = result.ValueOrDie();
+
+  const sockaddr_in6 kAddr = {
+      .sin6_family = AF_INET6,
+      .sin6_addr = in6addr_loopback,
+  };
+  ASSERT_THAT(bind(ping.get(), reinterpret_cast<const sockaddr*>(&kAddr),
+                   sizeof(kAddr)),
+              SyscallSucceeds());
+
+  icmp6_filter filter;
+  ICMP6_FILTER_SETPASSALL(&filter);
+  ICMP6_FILTER_SETBLOCK(ICMP6_ECHO_REPLY, &filter);
+  ASSERT_THAT(setsockopt(ping.get(), SOL_ICMPV6, ICMP6_FILTER, &filter,
+                         sizeof(filter)),
+              SyscallSucceeds());
+
+  icmp6_filter got_filter;
+  socklen_t got_filter_len = sizeof(got_filter);
+  ASSERT_THAT(getsockopt(ping.get(), SOL_ICMPV6, ICMP6_FILTER, &got_filter,
+                         &got_filter_len),
+              SyscallSucceeds());
+  ASSERT_EQ(got_filter_len, sizeof(got_filter));
+  EXPECT_EQ(memcmp(&got_filter, &filter, sizeof(filter)), 0);
+
+  constexpr icmp6_hdr kSendIcmp = {
+      .icmp6_type = ICMP6_ECHO_REQUEST,
+  };
+  ASSERT_THAT(sendto(ping.get(), &kSendIcmp, sizeof(kSendIcmp), 0,
+                     reinterpret_cast<const sockaddr*>(&kAddr), sizeof(kAddr)),
+              SyscallSucceedsWithValue(sizeof(kSendIcmp)));
+
+  // The echo reply is filtered out.
+  constexpr int kTimeoutMs = 100;
+  pollfd pfd = {
+      .fd = ping.get(),
+      .events = POLLIN,
+  };
+  EXPECT_THAT(RetryEINTR(poll)(&pfd, 1, kTimeoutMs),
+              SyscallSucceedsWithValue(0));
+}
+
+TEST(PingSocket, PingGroupRange) {
+  // Don't change the host's configuration.
+  SKIP_IF(!IsRunningOnGvisor());
+
+  constexpr char kPingGroupRange[] = "/proc/sys/net/ipv4/ping_group_range";
+  const std::string orig =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents(kPingGroupRange));
+  auto restore = Cleanup(
+      [&] { EXPECT_NO_ERRNO(SetContents(kPingGroupRange, orig)); });
+
+  // An empty range disallows all groups.
+  ASSERT_NO_ERRNO(SetContents(kPingGroupRange, "1 0"));
+  EXPECT_THAT(GetContents(kPingGroupRange), IsPosixErrorOkAndHolds("1\t0\n"));
+  EXPECT_THAT(socket(AF_INET, SOCK_DGRAM, IPPROTO_ICMP),
+              SyscallFailsWithErrno(EACCES));
+  EXPECT_THAT(socket(AF_INET6, SOCK_DGRAM, IPPROTO_ICMPV6),
+              SyscallFailsWithErrno(EACCES));
+
+  // Allow the caller's group.
+  const std::string range = absl::StrCat(getegid(), " ", getegid());
+  ASSERT_NO_ERRNO(SetContents(kPingGroupRange, range));
+  EXPECT_NO_ERRNO(Socket(AF_INET, SOCK_DGRAM, IPPROTO_ICMP));
+  EXPECT_NO_ERRNO(Socket(AF_INET6, SOCK_DGRAM, IPPROTO_ICMPV6));
+
+  EXPECT_THAT(SetContents(kPingGroupRange, "-1 0"),
+              PosixErrorIs(EINVAL, ::testing::_));
+}
+
 struct BindTestCase {
   TestAddress bind_to;
   int want = 0;
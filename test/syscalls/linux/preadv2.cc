@@ -47,6 +47,10 @@ namespace {
 #define RWF_HIPRI 0x1
 #endif  // RWF_HIPRI
 
+#ifndef RWF_NOWAIT
+#define RWF_NOWAIT 0x8
+#endif  // RWF_NOWAIT
+
 constexpr int kBufSize = 1024;
 
 std::string SetContent() {
@@ -292,6 +296,61 @@ TEST(Preadv2Test, TestUnseekableFileValid) {
   EXPECT_THAT(close(pipe_fds[1]), SyscallSucceeds());
 }
 
+// Reading recently written data with RWF_NOWAIT succeeds, since it is cached.
+TEST(Preadv2Test, TestCallWithRWF_NOWAIT) {
+  SKIP_IF(preadv2(-1, nullptr, 0, 0, 0) < 0 && errno == ENOSYS);
+
+  std::string content = SetContent();
+
+  const TempPath file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      GetAbsoluteTestTmpdir(), content, TempPath::kDefaultFileMode));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+
+  std::vector<char> buf(kBufSize, '0');
+  struct iovec iov;
+  iov.iov_base = buf.data();
+  iov.iov_len = buf.size();
+
+  // Not all filesystems support RWF_NOWAIT.
+  ssize_t n = preadv2(fd.get(), &iov, /*iovcnt=*/1, /*offset=*/0,
+                      /*flags=*/RWF_NOWAIT);
+  SKIP_IF(n < 0 && (errno == EOPNOTSUPP || errno == EAGAIN));
+  ASSERT_THAT(n, SyscallSucceedsWithValue(kBufSize));
+
+  EXPECT_THAT(lseek(fd.get(), 0, SEEK_CUR), SyscallSucceedsWithValue(0));
+
+  EXPECT_EQ(content, std::string(buf.data(), buf.size()));
+}
+
+// Reading an empty pipe with RWF_NOWAIT fails with EAGAIN rather than
+// blocking, even though the pipe is in blocking mode.
+TEST(Preadv2Test, TestUnseekableFileRWF_NOWAIT) {
+  SKIP_IF(preadv2(-1, nullptr, 0, 0, 0) < 0 && errno == ENOSYS);
+
+  int pipe_fds[2];
+
+  ASSERT_THAT(pipe(pipe_fds), SyscallSucceeds());
+
+  std::vector<char> buf(32);
+  struct iovec iov;
+  iov.iov_base = buf.data();
+  iov.iov_len = buf.size();
+
+  ssize_t n = preadv2(pipe_fds[0], &iov, /*iovcnt=*/1,
+                      /*offset=*/static_cast<off_t>(-1), /*flags=*/RWF_NOWAIT);
+  if (n < 0 && errno == EOPNOTSUPP) {
+    // Pipes don't support RWF_NOWAIT on older kernels.
+    EXPECT_THAT(close(pipe_fds[0]), SyscallSucceeds());
+    EXPECT_THAT(close(pipe_fds[1]), SyscallSucceeds());
+    GTEST_SKIP();
+  }
+  EXPECT_THAT(n, SyscallFailsWithErrno(EAGAIN));
+
+  EXPECT_THAT(close(pipe_fds[0]), SyscallSucceeds());
+  EXPECT_THAT(close(pipe_fds[1]), SyscallSucceeds());
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -17,6 +17,7 @@
 #include <fcntl.h>
 #include <limits.h>
 #include <linux/magic.h>
+#include <poll.h>
 #include <sched.h>
 #include <signal.h>
 #include <stddef.h>
@@ -27,6 +28,7 @@
 #include <sys/mman.h>
 #include <sys/prctl.h>
 #include <sys/ptrace.h>
+#include <sys/resource.h>
 #include <sys/stat.h>
 #include <sys/statfs.h>
 #include <sys/utsname.h>
@@ -1890,6 +1892,107 @@ TEST(ProcPidEnviron, MatchesEnviron) {
   EXPECT_THAT(env, ContainerEq(proc_environ));
 }
 
+TEST(ProcPidLimits, ReflectsSetrlimit) {
+  struct rlimit rl = {};
+  ASSERT_THAT(getrlimit(RLIMIT_NOFILE, &rl), SyscallSucceeds());
+  const struct rlimit orig = rl;
+  auto cleanup = Cleanup([&orig] {
+    EXPECT_THAT(setrlimit(RLIMIT_NOFILE, &orig), SyscallSucceeds());
+  });
+
+  rl.rlim_cur--;
+  ASSERT_THAT(setrlimit(RLIMIT_NOFILE, &rl), SyscallSucceeds());
+
+  std::vector<std::string> lines = absl::StrSplit(
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/self/limits")), '\n');
+  ASSERT_FALSE(lines.empty());
+  EXPECT_THAT(lines[0], ::testing::StartsWith("Limit "));
+  EXPECT_THAT(lines, Contains(absl::StrFormat("%-25s %-20d %-20d %-10s",
+                                              "Max open files", rl.rlim_cur,
+                                              rl.rlim_max, "files")));
+}
+
+TEST(ProcPidCoredumpFilter, ReadWrite) {
+  const std::string orig =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/self/coredump_filter"));
+  ASSERT_EQ(orig.size(), 9);
+  EXPECT_EQ(orig.back(), '\n');
+
+  ASSERT_NO_ERRNO(SetContents("/proc/self/coredump_filter", "0x1"));
+  EXPECT_THAT(GetContents("/proc/self/coredump_filter"),
+              IsPosixErrorOkAndHolds("00000001\n"));
+
+  // The filter is inherited by child processes.
+  pid_t child = fork();
+  if (child == 0) {
+    auto contents = GetContents("/proc/self/coredump_filter");
+    TEST_CHECK(contents.ok() && contents.ValueOrDie() == "00000001\n");
+    _exit(0);
+  }
+  ASSERT_THAT(child, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child, &status, 0),
+              SyscallSucceedsWithValue(child));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status = " << status;
+
+  EXPECT_THAT(SetContents("/proc/self/coredump_filter", "foo"),
+              PosixErrorIs(EINVAL, ::testing::_));
+
+  ASSERT_NO_ERRNO(SetContents("/proc/self/coredump_filter", orig));
+}
+
+TEST(ProcPressure, Format) {
+  SKIP_IF(!IsRunningOnGvisor() && access("/proc/pressure", F_OK) != 0);
+
+  const std::regex line_re(
+      "(some|full) avg10=[0-9]+\\.[0-9]{2} avg60=[0-9]+\\.[0-9]{2} "
+      "avg300=[0-9]+\\.[0-9]{2} total=[0-9]+");
+  for (const char* res : {"cpu", "io", "memory"}) {
+    const std::string path = absl::StrCat("/proc/pressure/", res);
+    const std::string contents = ASSERT_NO_ERRNO_AND_VALUE(GetContents(path));
+    std::vector<std::string> lines =
+        absl::StrSplit(contents, '\n', absl::SkipEmpty());
+    ASSERT_EQ(lines.size(), 2) << path << ": " << contents;
+    EXPECT_TRUE(absl::StartsWith(lines[0], "some ")) << lines[0];
+    EXPECT_TRUE(absl::StartsWith(lines[1], "full ")) << lines[1];
+    for (const auto& line : lines) {
+      EXPECT_TRUE(std::regex_match(line, line_re)) << path << ": " << line;
+    }
+  }
+}
+
+TEST(ProcPressure, Trigger) {
+  SKIP_IF(!IsRunningOnGvisor() &&
+          (access("/proc/pressure", F_OK) != 0 ||
+           !ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_RESOURCE))));
+  // Unprivileged triggers must use a multiple of 2s as their window.
+  constexpr char kTrigger[] = "some 150000 2000000";
+
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open("/proc/pressure/memory", O_RDWR | O_NONBLOCK));
+  ASSERT_THAT(WriteFd(fd.get(), kTrigger, sizeof(kTrigger)),
+              SyscallSucceedsWithValue(sizeof(kTrigger)));
+
+  // Only one trigger may be written to each FD.
+  EXPECT_THAT(WriteFd(fd.get(), kTrigger, sizeof(kTrigger)),
+              SyscallFailsWithErrno(EBUSY));
+
+  // An armed trigger only reports POLLPRI.
+  struct pollfd pfd = {.fd = fd.get(), .events = POLLIN | POLLPRI};
+  ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, 0), SyscallSucceeds());
+  EXPECT_EQ(pfd.revents & (POLLIN | POLLERR), 0);
+
+  const FileDescriptor fd2 = ASSERT_NO_ERRNO_AND_VALUE(
+      Open("/proc/pressure/memory", O_RDWR | O_NONBLOCK));
+  for (const char* trigger :
+       {"some 0 2000000", "some 150000 100", "none 150000 2000000"}) {
+    EXPECT_THAT(WriteFd(fd2.get(), trigger, strlen(trigger) + 1),
+                SyscallFailsWithErrno(EINVAL))
+        << trigger;
+  }
+}
+
 TEST(ProcPidCmdline, SubprocessForkSameCmdline) {
   std::vector<std::string> proc_cmdline_parent;
   std::vector<std::string> proc_cmdline;
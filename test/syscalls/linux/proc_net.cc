@@ -16,10 +16,13 @@
 #include <errno.h>
 #include <netinet/in.h>
 #include <poll.h>
+#include <sched.h>
 #include <sys/socket.h>
+#include <sys/stat.h>
 #include <sys/syscall.h>
 #include <sys/types.h>
 
+#include <string>
 #include <vector>
 
 #include "gtest/gtest.h"
@@ -29,8 +32,10 @@
 #include "absl/strings/string_view.h"
 #include "absl/time/clock.h"
 #include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
+#include "test/util/multiprocess_util.h"
 #include "test/util/socket_util.h"
 #include "test/util/test_util.h"
 
@@ -41,6 +46,7 @@ namespace {
 constexpr const char kProcNet[] = "/proc/net";
 constexpr const char kIpForward[] = "/proc/sys/net/ipv4/ip_forward";
 constexpr const char kRangeFile[] = "/proc/sys/net/ipv4/ip_local_port_range";
+constexpr const char kRetries2[] = "/proc/sys/net/ipv4/tcp_retries2";
 
 TEST(ProcNetSymlinkTarget, FileMode) {
   struct stat s;
@@ -73,6 +79,41 @@ TEST(ProcNetIfInet6, Format) {
                   "^([a-f0-9]{32}( [a-f0-9]{2}){4} +[a-z][a-z0-9]*\n)+$"));
 }
 
+// Returns true if the /proc/net file at path has an entry for the socket fd.
+PosixErrorOr<bool> ProcNetHasSocket(const std::string& path, int fd) {
+  struct stat st;
+  if (fstat(fd, &st) < 0) {
+    return PosixError(errno, "fstat");
+  }
+  ASSIGN_OR_RETURN_ERRNO(std::string contents, GetContents(path));
+  for (absl::string_view line : absl::StrSplit(contents, '\n')) {
+    std::vector<absl::string_view> fields =
+        absl::StrSplit(line, ' ', absl::SkipEmpty());
+    // The inode is the 10th field of entries, e.g.
+    // "   3: 00000000:0001 00000000:0000 07 00000000:00000000 00:00000000 "
+    // "00000000     0        0 3 2 0000000000000000 0".
+    if (fields.size() > 9 && fields[9] == absl::StrCat(st.st_ino)) {
+      return true;
+    }
+  }
+  return false;
+}
+
+TEST(ProcNetUDP6, Entry) {
+  FileDescriptor sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET6, SOCK_DGRAM, IPPROTO_UDP));
+  EXPECT_TRUE(ASSERT_NO_ERRNO_AND_VALUE(
+      ProcNetHasSocket("/proc/net/udp6", sock.get())));
+}
+
+TEST(ProcNetRaw, Entry) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+  FileDescriptor sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_RAW, IPPROTO_ICMP));
+  EXPECT_TRUE(ASSERT_NO_ERRNO_AND_VALUE(
+      ProcNetHasSocket("/proc/net/raw", sock.get())));
+}
+
 TEST(ProcSysNetIpv4Sack, Exists) {
   EXPECT_THAT(open("/proc/sys/net/ipv4/tcp_sack", O_RDONLY), SyscallSucceeds());
 }
@@ -574,6 +615,35 @@ TEST(ProcSysNetIpv4Recovery, CanReadAndWrite) {
   EXPECT_EQ(strcmp(buf, "100\n"), 0);
 }
 
+TEST(ProcSysNetIpv4Retries2, CanReadAndWrite) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+
+  std::string const orig = ASSERT_NO_ERRNO_AND_VALUE(GetContents(kRetries2));
+  auto cleanup =
+      Cleanup([&] { EXPECT_NO_ERRNO(SetContents(kRetries2, orig)); });
+
+  ASSERT_NO_ERRNO(SetContents(kRetries2, "8"));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(kRetries2)), "8\n");
+}
+
+TEST(ProcSysNetIpv4Retries2, PerNetworkNamespace) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_DAC_OVERRIDE))));
+
+  std::string const orig = ASSERT_NO_ERRNO_AND_VALUE(GetContents(kRetries2));
+
+  // Changing tcp_retries2 in a new network namespace doesn't affect the
+  // original one.
+  EXPECT_THAT(InForkedProcess([] {
+                TEST_CHECK(unshare(CLONE_NEWNET) == 0);
+                TEST_CHECK(SetContents(kRetries2, "3").ok());
+                auto contents = GetContents(kRetries2);
+                TEST_CHECK(contents.ok() && contents.ValueOrDie() == "3\n");
+              }),
+              IsPosixErrorOkAndHolds(0));
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(GetContents(kRetries2)), orig);
+}
+
 TEST(ProcSysNetIpv4IpForward, Exists) {
   auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kIpForward, O_RDONLY));
 }
@@ -13,6 +13,7 @@
 // limitations under the License.
 
 #include <netinet/tcp.h>
+#include <poll.h>
 #include <sys/socket.h>
 #include <sys/stat.h>
 #include <sys/types.h>
@@ -22,8 +23,11 @@
 #include "absl/strings/numbers.h"
 #include "absl/strings/str_join.h"
 #include "absl/strings/str_split.h"
+#include "absl/time/clock.h"
+#include "absl/time/time.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
 #include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
 #include "test/util/test_util.h"
 
 namespace gvisor {
@@ -47,6 +51,9 @@ struct TCPEntry {
   uint16_t remote_port;
 
   uint64_t state;
+  uint64_t tx_queue;
+  uint64_t rx_queue;
+  uint64_t timer;
   uint64_t uid;
   uint64_t inode;
 };
@@ -131,6 +138,9 @@ PosixErrorOr<std::vector<TCPEntry>> ProcNetTCPEntries() {
     ASSIGN_OR_RETURN_ERRNO(entry.remote_port, AtoiBase(fields[4], 16));
 
     ASSIGN_OR_RETURN_ERRNO(entry.state, AtoiBase(fields[5], 16));
+    ASSIGN_OR_RETURN_ERRNO(entry.tx_queue, AtoiBase(fields[6], 16));
+    ASSIGN_OR_RETURN_ERRNO(entry.rx_queue, AtoiBase(fields[7], 16));
+    ASSIGN_OR_RETURN_ERRNO(entry.timer, AtoiBase(fields[8], 16));
     ASSIGN_OR_RETURN_ERRNO(entry.uid, Atoi<uint64_t>(fields[11]));
     ASSIGN_OR_RETURN_ERRNO(entry.inode, Atoi<uint64_t>(fields[13]));
 
@@ -198,6 +208,70 @@ TEST(ProcNetTCP, InodeReasonable) {
   EXPECT_NE(accepted_entry.inode, client_entry.inode);
 }
 
+TEST(ProcNetTCP, InodeMatchesFD) {
+  auto sockets =
+      ASSERT_NO_ERRNO_AND_VALUE(IPv4TCPAcceptBindSocketPair(0).Create());
+  std::vector<TCPEntry> entries =
+      ASSERT_NO_ERRNO_AND_VALUE(ProcNetTCPEntries());
+
+  TCPEntry client_entry;
+  ASSERT_TRUE(FindByRemoteAddr(entries, &client_entry, sockets->first_addr()));
+  struct stat st;
+  ASSERT_THAT(fstat(sockets->second_fd(), &st), SyscallSucceeds());
+  EXPECT_EQ(client_entry.inode, st.st_ino);
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(
+                ReadLink(absl::StrCat("/proc/self/fd/", sockets->second_fd()))),
+            absl::StrCat("socket:[", st.st_ino, "]"));
+}
+
+TEST(ProcNetTCP, ReceiveQueue) {
+  auto sockets =
+      ASSERT_NO_ERRNO_AND_VALUE(IPv4TCPAcceptBindSocketPair(0).Create());
+  char buf[100] = {};
+  ASSERT_THAT(WriteFd(sockets->second_fd(), buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  struct pollfd pfd = {.fd = sockets->first_fd(), .events = POLLIN};
+  ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, 10000), SyscallSucceedsWithValue(1));
+
+  std::vector<TCPEntry> entries =
+      ASSERT_NO_ERRNO_AND_VALUE(ProcNetTCPEntries());
+  TCPEntry accepted_entry;
+  ASSERT_TRUE(FindByLocalAddr(entries, &accepted_entry, sockets->first_addr()));
+  EXPECT_EQ(accepted_entry.rx_queue, sizeof(buf));
+}
+
+TEST(ProcNetTCP, TimeWait) {
+  auto sockets =
+      ASSERT_NO_ERRNO_AND_VALUE(IPv4TCPAcceptBindSocketPair(0).Create());
+  struct sockaddr_storage client_addr;
+  socklen_t addrlen = sizeof(client_addr);
+  ASSERT_THAT(getsockname(sockets->second_fd(),
+                          reinterpret_cast<struct sockaddr*>(&client_addr),
+                          &addrlen),
+              SyscallSucceeds());
+
+  // Closing the client first leaves it in TIME-WAIT once the accepted socket
+  // is closed too, with no socket file.
+  ASSERT_THAT(close(sockets->release_second_fd()), SyscallSucceeds());
+  ASSERT_THAT(close(sockets->release_first_fd()), SyscallSucceeds());
+
+  TCPEntry entry;
+  const absl::Time deadline = absl::Now() + absl::Seconds(10);
+  while (true) {
+    std::vector<TCPEntry> entries =
+        ASSERT_NO_ERRNO_AND_VALUE(ProcNetTCPEntries());
+    if (FindByLocalAddr(entries, &entry,
+                        reinterpret_cast<struct sockaddr*>(&client_addr)) &&
+        entry.state == TCP_TIME_WAIT) {
+      break;
+    }
+    ASSERT_LT(absl::Now(), deadline) << "client never entered TIME-WAIT";
+    absl::SleepFor(absl::Milliseconds(10));
+  }
+  EXPECT_EQ(entry.inode, 0);
+  EXPECT_EQ(entry.timer, 3);
+}
+
 TEST(ProcNetTCP, State) {
   std::unique_ptr<FileDescriptor> server =
       ASSERT_NO_ERRNO_AND_VALUE(IPv4TCPUnboundSocket(0).Create());
@@ -14,6 +14,7 @@
 
 #include <stddef.h>
 #include <stdint.h>
+#include <string.h>
 
 #include <algorithm>
 #include <iostream>
@@ -30,6 +31,7 @@
 #include "test/util/file_descriptor.h"
 #include "test/util/fs_util.h"
 #include "test/util/memory_util.h"
+#include "test/util/multiprocess_util.h"
 #include "test/util/posix_error.h"
 #include "test/util/proc_util.h"
 #include "test/util/temp_path.h"
@@ -441,6 +443,65 @@ TEST(ProcPidSmapsTest, SharedReadOnlyFile) {
   }
 }
 
+TEST(ProcPidSmapsTest, PrivateAnonSharedAfterFork) {
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(4 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  // Touch every page so that they are all resident in the parent.
+  memset(m.ptr(), 1, m.len());
+
+  // Until either process writes to them, the pages are mapped by both the
+  // parent and the child, so they are shared and each process is accounted for
+  // half of them in PSS.
+  const auto rest = [&] {
+    auto const entries = ReadProcSelfSmaps();
+    TEST_CHECK(entries.ok());
+    auto const entry = FindUniqueSmapsEntry(entries.ValueOrDie(), m.addr());
+    TEST_CHECK(entry.ok());
+    auto const& e = entry.ValueOrDie();
+    TEST_CHECK(e.rss_kb >= m.len() / 1024);
+    TEST_CHECK(e.shared_clean_kb + e.shared_dirty_kb >= m.len() / 1024);
+    if (e.pss_kb) {
+      TEST_CHECK(e.pss_kb.value() <= e.rss_kb - m.len() / 1024 / 2);
+    }
+  };
+  EXPECT_THAT(InForkedProcess(rest), IsPosixErrorOkAndHolds(0));
+}
+
+TEST(ProcPidSmapsTest, Rollup) {
+  Mapping const m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  memset(m.ptr(), 1, m.len());
+
+  auto const contents =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/self/smaps_rollup"));
+  std::vector<absl::string_view> lines =
+      absl::StrSplit(contents, '\n', absl::SkipEmpty());
+  ASSERT_FALSE(lines.empty());
+
+  // The first line looks like a maps entry covering the whole address space.
+  auto const header = ASSERT_NO_ERRNO_AND_VALUE(ParseProcMapsLine(lines[0]));
+  EXPECT_EQ(header.filename, "[rollup]");
+  EXPECT_LE(header.start, m.addr());
+  EXPECT_GE(header.end, m.addr() + m.len());
+
+  absl::optional<size_t> rss_kb;
+  absl::optional<size_t> pss_kb;
+  for (size_t i = 1; i < lines.size(); i++) {
+    std::vector<absl::string_view> key_value =
+        absl::StrSplit(lines[i], absl::MaxSplits(':', 1));
+    ASSERT_EQ(key_value.size(), 2) << lines[i];
+    if (key_value[0] == "Rss") {
+      rss_kb = ASSERT_NO_ERRNO_AND_VALUE(SmapsValueKb(key_value[1]));
+    } else if (key_value[0] == "Pss") {
+      pss_kb = ASSERT_NO_ERRNO_AND_VALUE(SmapsValueKb(key_value[1]));
+    }
+  }
+  ASSERT_TRUE(rss_kb);
+  ASSERT_TRUE(pss_kb);
+  EXPECT_GE(rss_kb.value(), m.len() / 1024);
+  EXPECT_LE(pss_kb.value(), rss_kb.value());
+}
+
 // Tests that gVisor's /proc/[pid]/smaps provides all of the fields we expect it
 // to, which as of this writing is all fields provided by Linux 4.4.
 TEST(ProcPidSmapsTest, GvisorFields) {
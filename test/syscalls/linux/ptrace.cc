@@ -15,9 +15,11 @@
 #include <elf.h>
 #include <signal.h>
 #include <stddef.h>
+#include <string.h>
 #include <sys/prctl.h>
 #include <sys/ptrace.h>
 #include <sys/socket.h>
+#include <sys/syscall.h>
 #include <sys/time.h>
 #include <sys/types.h>
 #include <sys/user.h>
@@ -101,6 +103,16 @@ constexpr auto kPtraceSetSigMask = static_cast<__ptrace_request>(0x420b);
 // sys/ptrace.h with Linux 4.14 [BZ #22433]").
 constexpr auto kPtraceSysemu = static_cast<__ptrace_request>(31);
 
+// PTRACE_PEEKSIGINFO and its arguments, which older glibc headers define
+// differently.
+constexpr auto kPtracePeekSiginfo = static_cast<__ptrace_request>(0x4209);
+constexpr uint32_t kPtracePeekSiginfoShared = 1;
+struct PtracePeekSiginfoArgs {
+  uint64_t off;
+  uint32_t flags;
+  int32_t nr;
+};
+
 // PTRACE_EVENT_STOP is not defined until glibc 2.26 (3f67d1a7021e "Add Linux
 // PTRACE_EVENT_STOP").
 constexpr int kPtraceEventStop = 128;
@@ -1295,6 +1307,93 @@ TEST(PtraceTest, GetSiginfo_SetSiginfo_SignalInjection) {
       << " status " << status;
 }
 
+TEST(PtraceTest, PeekSiginfo) {
+  pid_t const child_pid = fork();
+  if (child_pid == 0) {
+    // In child process.
+
+    // Block signals so that they stay pending.
+    sigset_t mask;
+    TEST_PCHECK(sigemptyset(&mask) == 0);
+    TEST_PCHECK(sigaddset(&mask, SIGUSR1) == 0);
+    TEST_PCHECK(sigaddset(&mask, SIGRTMIN) == 0);
+    TEST_PCHECK(sigprocmask(SIG_BLOCK, &mask, nullptr) == 0);
+
+    TEST_PCHECK(ptrace(PTRACE_TRACEME, 0, 0, 0) == 0);
+    MaybeSave();
+
+    // tgkill(2) queues SIGUSR1 for this thread, while sigqueue(3) queues
+    // SIGRTMIN for the whole thread group.
+    RaiseSignal(SIGUSR1);
+    union sigval value;
+    value.sival_int = 1;
+    TEST_PCHECK(sigqueue(getpid(), SIGRTMIN, value) == 0);
+    value.sival_int = 2;
+    TEST_PCHECK(sigqueue(getpid(), SIGRTMIN, value) == 0);
+    RaiseSignal(SIGSTOP);
+    _exit(0);
+  }
+  // In parent process.
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+
+  // Wait for the child to enter signal-delivery-stop for SIGSTOP.
+  int status;
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFSTOPPED(status) && WSTOPSIG(status) == SIGSTOP)
+      << " status " << status;
+
+  siginfo_t infos[4] = {};
+  PtracePeekSiginfoArgs args = {};
+  args.nr = 4;
+  ASSERT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(infos[0].si_signo, SIGUSR1);
+  EXPECT_EQ(infos[0].si_code, SI_TKILL);
+
+  args.flags = kPtracePeekSiginfoShared;
+  ASSERT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallSucceedsWithValue(2));
+  EXPECT_EQ(infos[0].si_signo, SIGRTMIN);
+  EXPECT_EQ(infos[0].si_code, SI_QUEUE);
+  EXPECT_EQ(infos[0].si_value.sival_int, 1);
+  EXPECT_EQ(infos[1].si_signo, SIGRTMIN);
+  EXPECT_EQ(infos[1].si_value.sival_int, 2);
+
+  // Skip the first signal.
+  args.off = 1;
+  ASSERT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(infos[0].si_value.sival_int, 2);
+
+  // Past the end of the queue.
+  args.off = 2;
+  EXPECT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallSucceedsWithValue(0));
+
+  args.off = 0;
+  args.nr = -1;
+  EXPECT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallFailsWithErrno(EINVAL));
+  args.nr = 1;
+  args.flags = 2;
+  EXPECT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Peeking doesn't dequeue the signals.
+  args.flags = kPtracePeekSiginfoShared;
+  ASSERT_THAT(ptrace(kPtracePeekSiginfo, child_pid, &args, infos),
+              SyscallSucceedsWithValue(1));
+
+  // Suppress SIGSTOP and detach from the child, expecting it to exit normally
+  // with the other signals still blocked.
+  ASSERT_THAT(ptrace(PTRACE_DETACH, child_pid, 0, 0), SyscallSucceeds());
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+}
+
 TEST(PtraceTest, SIGKILLDoesNotCauseSignalDeliveryStop) {
   pid_t const child_pid = fork();
   if (child_pid == 0) {
@@ -1401,6 +1500,86 @@ TEST(PtraceTest, GetRegSet) {
       << " status " << status;
 }
 
+#if defined(__x86_64__)
+TEST(PtraceTest, GetRegSetSetRegSetXstate) {
+  // Offsets in the XSAVE area, from the Intel SDM Vol. 1, Section 13.4.1
+  // "Legacy Region of an XSAVE Area", and of the XCR0 mask that Linux stores
+  // in its reserved bytes.
+  constexpr size_t kXmm0Offset = 160;
+  constexpr size_t kXCR0Offset = 464;
+  constexpr size_t kMinXstateSize = 512 + 64;
+  alignas(16) static const uint8_t kXmm0[16] = {
+      0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77,
+      0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff};
+
+  pid_t const child_pid = fork();
+  if (child_pid == 0) {
+    // In child process.
+    TEST_PCHECK(ptrace(PTRACE_TRACEME, 0, 0, 0) == 0);
+    MaybeSave();
+
+    // Load kXmm0 into %xmm0, stop with a raw kill(2) so that nothing else
+    // touches %xmm0, and check what %xmm0 holds when the tracer resumes us.
+    alignas(16) uint8_t got[16];
+    long ret;
+    pid_t const pid = getpid();
+    asm volatile(
+        "movdqu (%[in]), %%xmm0\n"
+        "syscall\n"
+        "movdqu %%xmm0, (%[out])\n"
+        : "=a"(ret)
+        : "a"(SYS_kill), "D"(pid), "S"(SIGSTOP), [in] "r"(kXmm0),
+          [out] "r"(got)
+        : "rcx", "r11", "xmm0", "memory");
+    TEST_PCHECK(ret == 0);
+    for (size_t i = 0; i < sizeof(got); i++) {
+      if (got[i] != static_cast<uint8_t>(~kXmm0[i])) {
+        _exit(1);
+      }
+    }
+    _exit(0);
+  }
+  // In parent process.
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+
+  // Wait for the child to send itself SIGSTOP and enter signal-delivery-stop.
+  int status;
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFSTOPPED(status) && WSTOPSIG(status) == SIGSTOP)
+      << " status " << status;
+
+  alignas(64) uint8_t xstate[16384] = {};
+  struct iovec iov;
+  iov.iov_base = xstate;
+  iov.iov_len = sizeof(xstate);
+  ASSERT_THAT(ptrace(PTRACE_GETREGSET, child_pid, NT_X86_XSTATE, &iov),
+              SyscallSucceeds());
+  EXPECT_GE(iov.iov_len, kMinXstateSize);
+  EXPECT_LE(iov.iov_len, sizeof(xstate));
+
+  // The XCR0 mask includes at least x87 and SSE state.
+  uint64_t xcr0;
+  memcpy(&xcr0, xstate + kXCR0Offset, sizeof(xcr0));
+  EXPECT_EQ(xcr0 & 0x3, 0x3);
+  EXPECT_EQ(0, memcmp(xstate + kXmm0Offset, kXmm0, sizeof(kXmm0)));
+
+  // Invert %xmm0 in the child.
+  for (size_t i = 0; i < sizeof(kXmm0); i++) {
+    xstate[kXmm0Offset + i] = ~kXmm0[i];
+  }
+  ASSERT_THAT(ptrace(PTRACE_SETREGSET, child_pid, NT_X86_XSTATE, &iov),
+              SyscallSucceeds());
+
+  // Suppress SIGSTOP and resume the child, which checks %xmm0.
+  ASSERT_THAT(ptrace(PTRACE_CONT, child_pid, 0, 0), SyscallSucceeds());
+  ASSERT_THAT(waitpid(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+}
+#endif  // defined(__x86_64__)
+
 TEST(PtraceTest, AttachingConvertsGroupStopToPtraceStop) {
   pid_t const child_pid = fork();
   if (child_pid == 0) {
@@ -13,8 +13,11 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <fcntl.h>
+#include <signal.h>
 #include <stdlib.h>
 #include <sys/resource.h>
+#include <sys/socket.h>
 #include <sys/time.h>
 #include <sys/types.h>
 #include <sys/wait.h>
@@ -23,6 +26,7 @@
 #include <climits>
 
 #include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
 
@@ -75,6 +79,106 @@ TEST(RlimitTest, SetSoftRlimitAboveHard) {
   EXPECT_THAT(setrlimit(RLIMIT_NOFILE, &rl), SyscallFailsWithErrno(EINVAL));
 }
 
+// Lowers the RLIMIT_NOFILE soft limit to cur for the lifetime of the returned
+// Cleanup.
+Cleanup LowerNoFileLimit(rlim_t cur) {
+  struct rlimit orig = {};
+  TEST_PCHECK(getrlimit(RLIMIT_NOFILE, &orig) == 0);
+  struct rlimit rl = orig;
+  rl.rlim_cur = cur;
+  TEST_PCHECK(setrlimit(RLIMIT_NOFILE, &rl) == 0);
+  return Cleanup([orig] {
+    EXPECT_THAT(setrlimit(RLIMIT_NOFILE, &orig), SyscallSucceeds());
+  });
+}
+
+TEST(RlimitTest, NoFileAboveNrOpen) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_RESOURCE)));
+
+  struct rlimit rl = {};
+  ASSERT_THAT(getrlimit(RLIMIT_NOFILE, &rl), SyscallSucceeds());
+
+  // Even privileged users can't raise the hard limit past fs.nr_open.
+  rl.rlim_max = RLIM_INFINITY;
+  EXPECT_THAT(setrlimit(RLIMIT_NOFILE, &rl), SyscallFailsWithErrno(EPERM));
+}
+
+TEST(RlimitTest, NoFileAtLimit) {
+  // dup returns the lowest free descriptor, so once it is taken every
+  // descriptor below the limit is in use.
+  int next;
+  ASSERT_THAT(next = dup(STDIN_FILENO), SyscallSucceeds());
+  ASSERT_THAT(close(next), SyscallSucceeds());
+  auto restore = LowerNoFileLimit(next + 1);
+
+  int fd;
+  ASSERT_THAT(fd = dup(STDIN_FILENO), SyscallSucceedsWithValue(next));
+  auto close_fd = Cleanup([fd] { EXPECT_THAT(close(fd), SyscallSucceeds()); });
+
+  EXPECT_THAT(dup(STDIN_FILENO), SyscallFailsWithErrno(EMFILE));
+  EXPECT_THAT(fcntl(STDIN_FILENO, F_DUPFD, 0), SyscallFailsWithErrno(EMFILE));
+  EXPECT_THAT(open("/dev/null", O_RDONLY), SyscallFailsWithErrno(EMFILE));
+  EXPECT_THAT(socket(AF_UNIX, SOCK_STREAM, 0), SyscallFailsWithErrno(EMFILE));
+  int fds[2];
+  EXPECT_THAT(pipe(fds), SyscallFailsWithErrno(EMFILE));
+}
+
+TEST(RlimitTest, NoFileDupBeyondLimit) {
+  constexpr rlim_t kLimit = 100;
+  auto restore = LowerNoFileLimit(kLimit);
+
+  // As in Linux, an explicit target descriptor beyond the limit is EBADF,
+  // while a minimum descriptor beyond it is EINVAL.
+  EXPECT_THAT(dup2(STDIN_FILENO, kLimit), SyscallFailsWithErrno(EBADF));
+  EXPECT_THAT(dup3(STDIN_FILENO, kLimit, O_CLOEXEC),
+              SyscallFailsWithErrno(EBADF));
+  EXPECT_THAT(fcntl(STDIN_FILENO, F_DUPFD, kLimit),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(fcntl(STDIN_FILENO, F_DUPFD_CLOEXEC, kLimit),
+              SyscallFailsWithErrno(EINVAL));
+
+  int fd;
+  ASSERT_THAT(fd = dup2(STDIN_FILENO, kLimit - 1),
+              SyscallSucceedsWithValue(kLimit - 1));
+  EXPECT_THAT(close(fd), SyscallSucceeds());
+}
+
+TEST(RlimitTest, PrlimitOtherProcess) {
+  pid_t pid = fork();
+  if (pid == 0) {
+    while (true) {
+      pause();
+    }
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  auto cleanup = Cleanup([pid] {
+    EXPECT_THAT(kill(pid, SIGKILL), SyscallSucceeds());
+    EXPECT_THAT(waitpid(pid, nullptr, 0), SyscallSucceedsWithValue(pid));
+  });
+
+  struct rlimit old = {};
+  ASSERT_THAT(prlimit(pid, RLIMIT_NOFILE, nullptr, &old), SyscallSucceeds());
+
+  // Lowering the limits of a process with the same credentials needs no
+  // privilege.
+  struct rlimit rl = old;
+  rl.rlim_cur = rl.rlim_cur / 2;
+  struct rlimit prev = {};
+  ASSERT_THAT(prlimit(pid, RLIMIT_NOFILE, &rl, &prev), SyscallSucceeds());
+  EXPECT_EQ(prev.rlim_cur, old.rlim_cur);
+  EXPECT_EQ(prev.rlim_max, old.rlim_max);
+
+  struct rlimit got = {};
+  ASSERT_THAT(prlimit(pid, RLIMIT_NOFILE, nullptr, &got), SyscallSucceeds());
+  EXPECT_EQ(got.rlim_cur, rl.rlim_cur);
+  EXPECT_EQ(got.rlim_max, rl.rlim_max);
+
+  // The caller's own limits are unaffected.
+  struct rlimit self = {};
+  ASSERT_THAT(getrlimit(RLIMIT_NOFILE, &self), SyscallSucceeds());
+  EXPECT_EQ(self.rlim_cur, old.rlim_cur);
+}
+
 TEST(RlimitTest, RlimitNProc) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETUID)));
 
@@ -95,11 +199,14 @@ TEST(RlimitTest, RlimitNProc) {
     rl.rlim_cur = kNProc;
     EXPECT_THAT(setrlimit(RLIMIT_NPROC, &rl), SyscallSucceeds());
 
+    // As in Linux, this thread is counted against the limit of its new real
+    // UID, leaving room for kNProc - 1 children.
+    constexpr int kChildren = kNProc - 1;
     constexpr int kIterations = 2;
     // Run test actions a few times to check that processes are not leaked.
     for (int iter = 0; iter < kIterations; iter++) {
-      pid_t pids[kNProc];
-      for (int i = 0; i < kNProc; i++) {
+      pid_t pids[kChildren];
+      for (int i = 0; i < kChildren; i++) {
         pid_t pid = fork();
         if (pid == 0) {
           while (1) {
@@ -111,7 +218,7 @@ TEST(RlimitTest, RlimitNProc) {
         pids[i] = pid;
       }
       auto cleanup = Cleanup([pids] {
-        for (int i = 0; i < kNProc; i++) {
+        for (int i = 0; i < kChildren; i++) {
           if (pids[i] < 0) {
             continue;
           }
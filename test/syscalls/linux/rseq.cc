@@ -196,6 +196,14 @@ TEST(RseqTest, InvalidAbortClearsCS) {
   RunChildTest(kRseqTestInvalidAbortClearsCS, 0);
 }
 
+// Per-CPU data updated in critical sections by preempted and migrated
+// processes loses no updates.
+TEST(RseqTest, PerCPUCounter) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(RSeqSupported()));
+
+  RunChildTest(kRseqTestPerCPUCounter, 0);
+}
+
 }  // namespace
 
 }  // namespace testing
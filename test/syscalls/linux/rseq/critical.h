@@ -34,6 +34,12 @@ extern void* rseq_getpid_start;
 extern void* rseq_getpid_post_commit;
 extern void* rseq_getpid_abort;
 
+extern int rseq_percpu_inc(struct rseq* r, struct rseq_cs* cs,
+                           uint64_t* counters);
+extern void* rseq_percpu_inc_start;
+extern void* rseq_percpu_inc_post_commit;
+extern void* rseq_percpu_inc_abort;
+
 }  // extern "C"
 
 #endif  // GVISOR_TEST_SYSCALLS_LINUX_RSEQ_CRITICAL_H_
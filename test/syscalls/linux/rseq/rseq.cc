@@ -319,6 +319,83 @@ int TestInvalidAbortClearsCS() {
   return 0;
 }
 
+constexpr int kPerCPUCounterProcesses = 8;
+constexpr int kPerCPUCounterIncrements = 100000;
+constexpr int kPerCPUCounterMaxCPUs = 4096;
+
+// Increments per-CPU counters kPerCPUCounterIncrements times.
+int PerCPUCounterChild(uint64_t* counters) {
+  struct rseq r = {};
+  int ret = sys_rseq(&r, sizeof(r), 0, kRseqSignature);
+  if (sys_errno(ret) != 0) {
+    return 1;
+  }
+
+  struct rseq_cs cs = {};
+  cs.version = 0;
+  cs.flags = 0;
+  cs.start_ip = reinterpret_cast<uint64_t>(&rseq_percpu_inc_start);
+  cs.post_commit_offset =
+      reinterpret_cast<uint64_t>(&rseq_percpu_inc_post_commit) -
+      reinterpret_cast<uint64_t>(&rseq_percpu_inc_start);
+  cs.abort_ip = reinterpret_cast<uint64_t>(&rseq_percpu_inc_abort);
+
+  for (int done = 0; done < kPerCPUCounterIncrements;) {
+    if (__atomic_load_n(&r.cpu_id, __ATOMIC_RELAXED) >=
+        kPerCPUCounterMaxCPUs) {
+      return 1;
+    }
+    if (rseq_percpu_inc(&r, &cs, counters) == 0) {
+      done++;
+    }
+  }
+  return 0;
+}
+
+// Per-CPU counters incremented in critical sections by more processes than
+// there are CPUs, such that processes are preempted and migrated, lose no
+// updates.
+int TestPerCPUCounter() {
+  uintptr_t addr =
+      sys_mmap(nullptr, kPerCPUCounterMaxCPUs * sizeof(uint64_t),
+               PROT_READ | PROT_WRITE, MAP_SHARED | MAP_ANONYMOUS, -1, 0);
+  if (sys_errno(addr) != 0) {
+    return 1;
+  }
+  uint64_t* counters = reinterpret_cast<uint64_t*>(addr);
+
+  for (int i = 0; i < kPerCPUCounterProcesses; i++) {
+    int pid = sys_fork();
+    if (pid == 0) {
+      sys_exit_group(PerCPUCounterChild(counters));
+    }
+    if (sys_errno(pid) != 0) {
+      return 1;
+    }
+  }
+
+  int ret = 0;
+  for (int i = 0; i < kPerCPUCounterProcesses; i++) {
+    int status = 0;
+    if (sys_errno(sys_wait4(-1, &status, 0)) != 0 || status != 0) {
+      ret = 1;
+    }
+  }
+  if (ret != 0) {
+    return ret;
+  }
+
+  uint64_t sum = 0;
+  for (int i = 0; i < kPerCPUCounterMaxCPUs; i++) {
+    sum += counters[i];
+  }
+  if (sum != static_cast<uint64_t>(kPerCPUCounterProcesses) *
+                 kPerCPUCounterIncrements) {
+    return 1;
+  }
+  return 0;
+}
+
 // Exit codes:
 //  0 - Pass
 //  1 - Fail
@@ -369,6 +446,9 @@ extern "C" int main(int argc, char** argv, char** envp) {
   if (strcmp(argv[1], kRseqTestInvalidAbortClearsCS) == 0) {
     return TestInvalidAbortClearsCS();
   }
+  if (strcmp(argv[1], kRseqTestPerCPUCounter) == 0) {
+    return TestPerCPUCounter();
+  }
 
   return 3;
 }
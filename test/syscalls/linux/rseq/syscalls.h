@@ -19,10 +19,16 @@
 
 // Syscall numbers.
 #if defined(__x86_64__)
+constexpr int kMmap = 9;
 constexpr int kGetpid = 39;
+constexpr int kClone = 56;
+constexpr int kWait4 = 61;
 constexpr int kExitGroup = 231;
 #elif defined(__aarch64__)
+constexpr int kMmap = 222;
 constexpr int kGetpid = 172;
+constexpr int kClone = 220;
+constexpr int kWait4 = 260;
 constexpr int kExitGroup = 94;
 #else
 #error "Unknown architecture"
@@ -63,6 +69,27 @@ static inline int sys_getpid() {
   return static_cast<int>(raw_syscall(kGetpid));
 }
 
+// Memory protection and mapping flags for sys_mmap.
+#define PROT_READ 0x1
+#define PROT_WRITE 0x2
+#define MAP_SHARED 0x01
+#define MAP_ANONYMOUS 0x20
+
+static inline uintptr_t sys_mmap(void* addr, size_t length, int prot,
+                                 int flags, int fd, int64_t offset) {
+  return raw_syscall(kMmap, addr, length, prot, flags, fd, offset);
+}
+
+// Creates a child process, as fork(2). Returns 0 in the child.
+static inline int sys_fork() {
+  constexpr int kSIGCHLD = 17;
+  return static_cast<int>(raw_syscall(kClone, kSIGCHLD, 0, 0, 0, 0));
+}
+
+static inline int sys_wait4(int pid, int* status, int options) {
+  return static_cast<int>(raw_syscall(kWait4, pid, status, options, 0));
+}
+
 }  // namespace testing
 }  // namespace gvisor
 
@@ -34,6 +34,7 @@ constexpr char kRseqTestAbortSignature[] = "abort-signature";
 constexpr char kRseqTestAbortPreCommit[] = "abort-precommit";
 constexpr char kRseqTestAbortClearsCS[] = "abort-clears-cs";
 constexpr char kRseqTestInvalidAbortClearsCS[] = "invalid-abort-clears-cs";
+constexpr char kRseqTestPerCPUCounter[] = "percpu-counter";
 
 }  // namespace testing
 }  // namespace gvisor
@@ -20,6 +20,7 @@
 #include <sched.h>
 #include <signal.h>
 #include <string.h>
+#include <sys/ioctl.h>
 #include <sys/prctl.h>
 #include <sys/syscall.h>
 #include <time.h>
@@ -58,9 +59,10 @@ constexpr uint32_t kFilteredSyscall = __NR_arch_specific_syscall + 15;
 #endif
 
 // Applies a seccomp-bpf filter that returns `filtered_result` for
-// `sysno` and allows all other syscalls. Async-signal-safe.
-void ApplySeccompFilter(uint32_t sysno, uint32_t filtered_result,
-                        uint32_t flags = 0) {
+// `sysno` and allows all other syscalls. Returns the listener file descriptor
+// if `flags` contains SECCOMP_FILTER_FLAG_NEW_LISTENER. Async-signal-safe.
+int ApplySeccompFilter(uint32_t sysno, uint32_t filtered_result,
+                       uint32_t flags = 0) {
   // "Prior to [PR_SET_SECCOMP], the task must call prctl(PR_SET_NO_NEW_PRIVS,
   // 1) or run with CAP_SYS_ADMIN privileges in its namespace." -
   // Documentation/prctl/seccomp_filter.txt
@@ -96,13 +98,29 @@ void ApplySeccompFilter(uint32_t sysno, uint32_t filtered_result,
   struct sock_fprog prog;
   prog.len = ABSL_ARRAYSIZE(filter);
   prog.filter = filter;
+  int ret = 0;
   if (flags) {
-    TEST_CHECK(syscall(__NR_seccomp, SECCOMP_SET_MODE_FILTER, flags, &prog) ==
-               0);
+    ret = syscall(__NR_seccomp, SECCOMP_SET_MODE_FILTER, flags, &prog);
+    TEST_PCHECK(ret >= 0);
   } else {
     TEST_PCHECK(prctl(PR_SET_SECCOMP, SECCOMP_MODE_FILTER, &prog, 0, 0) == 0);
   }
   MaybeSave();
+  return ret;
+}
+
+// Receives a notification from the seccomp listener `fd`. Async-signal-safe.
+struct seccomp_notif ReceiveNotification(int fd) {
+  struct seccomp_notif notif = {};
+  TEST_PCHECK(ioctl(fd, SECCOMP_IOCTL_NOTIF_RECV, &notif) == 0);
+  return notif;
+}
+
+// Waits for `pid` to exit with status 0. Async-signal-safe.
+void WaitForSuccessfulExit(pid_t pid) {
+  int status;
+  TEST_PCHECK(waitpid(pid, &status, 0) == pid);
+  TEST_CHECK(WIFEXITED(status) && WEXITSTATUS(status) == 0);
 }
 
 // Wrapper for sigaction. Async-signal-safe.
@@ -381,6 +399,191 @@ TEST(SeccompTest, LeastPermissiveFilterReturnValueApplies) {
       << "status " << status;
 }
 
+TEST(SeccompTest, UserNotifReturnsResponse) {
+  pid_t const pid = fork();
+  if (pid == 0) {
+    int const fd = ApplySeccompFilter(kFilteredSyscall, SECCOMP_RET_USER_NOTIF,
+                                      SECCOMP_FILTER_FLAG_NEW_LISTENER);
+    pid_t const target = fork();
+    if (target == 0) {
+      TEST_CHECK(syscall(kFilteredSyscall, 1, 2) == 42);
+      TEST_CHECK(syscall(kFilteredSyscall) == -1 && errno == ENOTNAM);
+      _exit(0);
+    }
+    TEST_PCHECK(target > 0);
+
+    struct seccomp_notif notif = ReceiveNotification(fd);
+    TEST_CHECK(notif.pid == static_cast<uint32_t>(target));
+    TEST_CHECK(notif.data.nr == static_cast<int>(kFilteredSyscall));
+    TEST_CHECK(notif.data.args[0] == 1 && notif.data.args[1] == 2);
+    TEST_PCHECK(ioctl(fd, SECCOMP_IOCTL_NOTIF_ID_VALID, &notif.id) == 0);
+    struct seccomp_notif_resp resp = {};
+    resp.id = notif.id;
+    resp.val = 42;
+    TEST_PCHECK(ioctl(fd, SECCOMP_IOCTL_NOTIF_SEND, &resp) == 0);
+
+    // A notification can only be responded to once.
+    TEST_CHECK(ioctl(fd, SECCOMP_IOCTL_NOTIF_SEND, &resp) == -1 &&
+               errno == ENOENT);
+
+    notif = ReceiveNotification(fd);
+    resp = {};
+    resp.id = notif.id;
+    resp.error = -ENOTNAM;
+    TEST_PCHECK(ioctl(fd, SECCOMP_IOCTL_NOTIF_SEND, &resp) == 0);
+
+    WaitForSuccessfulExit(target);
+    _exit(0);
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(waitpid(pid, &status, 0), SyscallSucceedsWithValue(pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status " << status;
+}
+
+TEST(SeccompTest, UserNotifContinueExecutesSyscall) {
+  pid_t const pid = fork();
+  if (pid == 0) {
+    pid_t const supervisor = getpid();
+    int const fd = ApplySeccompFilter(SYS_getppid, SECCOMP_RET_USER_NOTIF,
+                                      SECCOMP_FILTER_FLAG_NEW_LISTENER);
+    pid_t const target = fork();
+    if (target == 0) {
+      TEST_CHECK(syscall(SYS_getppid) == supervisor);
+      _exit(0);
+    }
+    TEST_PCHECK(target > 0);
+
+    struct seccomp_notif notif = ReceiveNotification(fd);
+    struct seccomp_notif_resp resp = {};
+    resp.id = notif.id;
+    resp.flags = SECCOMP_USER_NOTIF_FLAG_CONTINUE;
+    TEST_PCHECK(ioctl(fd, SECCOMP_IOCTL_NOTIF_SEND, &resp) == 0);
+
+    WaitForSuccessfulExit(target);
+    _exit(0);
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(waitpid(pid, &status, 0), SyscallSucceedsWithValue(pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status " << status;
+}
+
+TEST(SeccompTest, UserNotifTargetKilled) {
+  pid_t const pid = fork();
+  if (pid == 0) {
+    int const fd = ApplySeccompFilter(kFilteredSyscall, SECCOMP_RET_USER_NOTIF,
+                                      SECCOMP_FILTER_FLAG_NEW_LISTENER);
+    pid_t const target = fork();
+    if (target == 0) {
+      syscall(kFilteredSyscall);
+      TEST_CHECK_MSG(false, "Survived invocation of test syscall");
+    }
+    TEST_PCHECK(target > 0);
+
+    struct seccomp_notif notif = ReceiveNotification(fd);
+    TEST_PCHECK(kill(target, SIGKILL) == 0);
+    int status;
+    TEST_PCHECK(waitpid(target, &status, 0) == target);
+    TEST_CHECK(WIFSIGNALED(status) && WTERMSIG(status) == SIGKILL);
+
+    TEST_CHECK(ioctl(fd, SECCOMP_IOCTL_NOTIF_ID_VALID, &notif.id) == -1 &&
+               errno == ENOENT);
+    struct seccomp_notif_resp resp = {};
+    resp.id = notif.id;
+    TEST_CHECK(ioctl(fd, SECCOMP_IOCTL_NOTIF_SEND, &resp) == -1 &&
+               errno == ENOENT);
+    _exit(0);
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(waitpid(pid, &status, 0), SyscallSucceedsWithValue(pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status " << status;
+}
+
+TEST(SeccompTest, UserNotifAddFD) {
+  pid_t const pid = fork();
+  if (pid == 0) {
+    int const fd = ApplySeccompFilter(kFilteredSyscall, SECCOMP_RET_USER_NOTIF,
+                                      SECCOMP_FILTER_FLAG_NEW_LISTENER);
+    pid_t const target = fork();
+    if (target == 0) {
+      int const newfd = syscall(kFilteredSyscall);
+      TEST_PCHECK(newfd >= 0);
+      TEST_PCHECK(write(newfd, "x", 1) == 1);
+      _exit(0);
+    }
+    TEST_PCHECK(target > 0);
+
+    // The pipe is created after the fork, so the target can only get it from
+    // the supervisor.
+    int pipefds[2];
+    TEST_PCHECK(pipe(pipefds) == 0);
+    struct seccomp_notif notif = ReceiveNotification(fd);
+    struct seccomp_notif_addfd addfd = {};
+    addfd.id = notif.id;
+    addfd.srcfd = pipefds[1];
+    addfd.flags = SECCOMP_ADDFD_FLAG_SEND;
+    TEST_PCHECK(ioctl(fd, SECCOMP_IOCTL_NOTIF_ADDFD, &addfd) >= 0);
+    TEST_PCHECK(close(pipefds[1]) == 0);
+
+    char c;
+    TEST_PCHECK(read(pipefds[0], &c, 1) == 1);
+    TEST_CHECK(c == 'x');
+    WaitForSuccessfulExit(target);
+    _exit(0);
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(waitpid(pid, &status, 0), SyscallSucceedsWithValue(pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status " << status;
+}
+
+TEST(SeccompTest, UserNotifListenerClosedReturnsENOSYS) {
+  pid_t const pid = fork();
+  if (pid == 0) {
+    int const fd = ApplySeccompFilter(kFilteredSyscall, SECCOMP_RET_USER_NOTIF,
+                                      SECCOMP_FILTER_FLAG_NEW_LISTENER);
+    pid_t const target = fork();
+    if (target == 0) {
+      TEST_CHECK(syscall(kFilteredSyscall) == -1 && errno == ENOSYS);
+      _exit(0);
+    }
+    TEST_PCHECK(target > 0);
+
+    ReceiveNotification(fd);
+    TEST_PCHECK(close(fd) == 0);
+    WaitForSuccessfulExit(target);
+    _exit(0);
+  }
+  ASSERT_THAT(pid, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(waitpid(pid, &status, 0), SyscallSucceedsWithValue(pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << "status " << status;
+}
+
+TEST(SeccompTest, UserNotifRejectsTsync) {
+  ASSERT_THAT(syscall(__NR_seccomp, SECCOMP_SET_MODE_FILTER,
+                      SECCOMP_FILTER_FLAG_TSYNC |
+                          SECCOMP_FILTER_FLAG_NEW_LISTENER,
+                      nullptr),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(SeccompTest, GetNotifSizes) {
+  struct seccomp_notif_sizes sizes = {};
+  ASSERT_THAT(syscall(__NR_seccomp, SECCOMP_GET_NOTIF_SIZES, 0, &sizes),
+              SyscallSucceeds());
+  EXPECT_EQ(sizes.seccomp_notif, sizeof(struct seccomp_notif));
+  EXPECT_EQ(sizes.seccomp_notif_resp, sizeof(struct seccomp_notif_resp));
+  EXPECT_EQ(sizes.seccomp_data, sizeof(struct seccomp_data));
+}
+
 // Passed as argv[1] to cause the test binary to invoke kFilteredSyscall and
 // exit. Not a real flag since flag parsing happens during initialization,
 // which may create threads.
@@ -18,7 +18,15 @@
 #include <sys/shm.h>
 #include <sys/types.h>
 
+#include <string>
+#include <vector>
+
+#include "gmock/gmock.h"
+#include "absl/strings/str_cat.h"
+#include "absl/strings/str_split.h"
 #include "absl/time/clock.h"
+#include "test/util/capability_util.h"
+#include "test/util/fs_util.h"
 #include "test/util/multiprocess_util.h"
 #include "test/util/posix_error.h"
 #include "test/util/temp_path.h"
@@ -31,6 +39,7 @@ namespace {
 using ::testing::_;
 using ::testing::AnyOf;
 using ::testing::Eq;
+using ::testing::HasSubstr;
 
 const uint64_t kAllocSize = kPageSize * 128ULL;
 
@@ -244,6 +253,71 @@ TEST(ShmTest, ShmStat) {
   // succeeds here.
 }
 
+#ifndef SHM_STAT_ANY
+#define SHM_STAT_ANY 15
+#endif  // SHM_STAT_ANY
+
+TEST(ShmTest, ShmStatReturnsID) {
+  // Drop CAP_IPC_OWNER which allows us to bypass segment permissions.
+  AutoCapability cap(CAP_IPC_OWNER, false);
+  const ShmSegment shm = ASSERT_NO_ERRNO_AND_VALUE(
+      Shmget(IPC_PRIVATE, kAllocSize, IPC_CREAT | 0600));
+
+  struct shm_info info;
+  const int max_used_index =
+      ASSERT_NO_ERRNO_AND_VALUE(Shmctl(0, SHM_INFO, &info));
+
+  bool found = false;
+  for (int i = 0; i <= max_used_index; i++) {
+    struct shmid_ds attr;
+    if (shmctl(i, SHM_STAT, &attr) != shm.id()) {
+      continue;
+    }
+    found = true;
+    EXPECT_EQ(attr.shm_segsz, kAllocSize);
+
+    // Remove the segment's read permission.
+    attr.shm_perm.mode = 0200;
+    ASSERT_NO_ERRNO(Shmctl(shm.id(), IPC_SET, &attr));
+    EXPECT_THAT(shmctl(i, SHM_STAT, &attr), SyscallFailsWithErrno(EACCES));
+    int val = shmctl(i, SHM_STAT_ANY, &attr);
+    if (val == -1) {
+      // Only if the kernel doesn't support the command SHM_STAT_ANY.
+      EXPECT_TRUE(errno == EINVAL || errno == EFAULT);
+    } else {
+      EXPECT_EQ(val, shm.id());
+      EXPECT_EQ(attr.shm_perm.mode, 0200);
+    }
+  }
+  EXPECT_TRUE(found);
+}
+
+TEST(ShmTest, ProcSysvipcShm) {
+  const ShmSegment shm = ASSERT_NO_ERRNO_AND_VALUE(
+      Shmget(IPC_PRIVATE, kAllocSize, IPC_CREAT | 0600));
+
+  const std::string contents =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/sysvipc/shm"));
+  std::vector<std::string> lines = absl::StrSplit(contents, '\n');
+  ASSERT_GE(lines.size(), 1);
+  EXPECT_THAT(lines[0], HasSubstr("shmid perms"));
+
+  bool found = false;
+  for (const std::string& line : lines) {
+    std::vector<std::string> fields =
+        absl::StrSplit(line, ' ', absl::SkipEmpty());
+    // key shmid perms size ...
+    if (fields.size() < 4 || fields[1] != absl::StrCat(shm.id())) {
+      continue;
+    }
+    found = true;
+    EXPECT_EQ(fields[0], "0");  // IPC_PRIVATE
+    EXPECT_EQ(fields[2], "600");
+    EXPECT_EQ(fields[3], absl::StrCat(kAllocSize));
+  }
+  EXPECT_TRUE(found);
+}
+
 TEST(ShmTest, IpcInfo) {
   struct shminfo info;
   ASSERT_NO_ERRNO(Shmctl(0, IPC_INFO, &info));
@@ -13,6 +13,7 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <fcntl.h>
 #include <poll.h>
 #include <signal.h>
 #include <stdio.h>
@@ -106,6 +107,47 @@ TEST(Signalfd, Cloexec) {
   EXPECT_THAT(fcntl(fd.get(), F_GETFD), SyscallSucceedsWithValue(FD_CLOEXEC));
 }
 
+TEST(Signalfd, UpdateReturnsFD) {
+  sigset_t mask;
+  sigemptyset(&mask);
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(NewSignalFD(&mask, 0));
+
+  sigaddset(&mask, kSigno);
+  EXPECT_THAT(signalfd(fd.get(), &mask, 0), SyscallSucceedsWithValue(fd.get()));
+}
+
+TEST(Signalfd, UpdateIgnoresFlags) {
+  sigset_t mask;
+  sigemptyset(&mask);
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(NewSignalFD(&mask, 0));
+
+  // Flags only apply to newly created signalfds.
+  sigaddset(&mask, kSigno);
+  ASSERT_THAT(signalfd(fd.get(), &mask, SFD_CLOEXEC | SFD_NONBLOCK),
+              SyscallSucceedsWithValue(fd.get()));
+  EXPECT_THAT(fcntl(fd.get(), F_GETFD), SyscallSucceedsWithValue(0));
+  int flags;
+  ASSERT_THAT(flags = fcntl(fd.get(), F_GETFL), SyscallSucceeds());
+  EXPECT_EQ(flags & O_NONBLOCK, 0);
+}
+
+TEST(Signalfd, UpdateInvalidFlags) {
+  sigset_t mask;
+  sigemptyset(&mask);
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(NewSignalFD(&mask, 0));
+
+  EXPECT_THAT(signalfd(fd.get(), &mask, ~(SFD_CLOEXEC | SFD_NONBLOCK)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(Signalfd, UpdateNotSignalfd) {
+  sigset_t mask;
+  sigemptyset(&mask);
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+
+  EXPECT_THAT(signalfd(fd.get(), &mask, 0), SyscallFailsWithErrno(EINVAL));
+}
+
 TEST_P(SignalfdTest, Blocking) {
   int signo = GetParam();
   // Create the signalfd in blocking mode.
@@ -28,6 +28,7 @@
 #include "absl/memory/memory.h"
 #include "absl/time/clock.h"
 #include "absl/time/time.h"
+#include "test/util/capability_util.h"
 #include "test/util/socket_util.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
@@ -97,6 +98,123 @@ TEST_P(TCPSocketPairTest, CheckTcpInfoFields) {
   EXPECT_GT(opt.tcpi_rto, 0);
 }
 
+TEST_P(TCPSocketPairTest, MaxPacingRate) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  // The default is unlimited.
+  uint64_t rate64 = 0;
+  socklen_t optLen = sizeof(rate64);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_MAX_PACING_RATE,
+                         &rate64, &optLen),
+              SyscallSucceeds());
+  EXPECT_EQ(optLen, sizeof(rate64));
+  EXPECT_EQ(rate64, ~0ULL);
+
+  uint32_t rate32 = 1 << 20;
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_MAX_PACING_RATE,
+                         &rate32, sizeof(rate32)),
+              SyscallSucceeds());
+  rate32 = 0;
+  optLen = sizeof(rate32);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_MAX_PACING_RATE,
+                         &rate32, &optLen),
+              SyscallSucceeds());
+  EXPECT_EQ(optLen, sizeof(rate32));
+  EXPECT_EQ(rate32, 1 << 20);
+
+  // 64-bit rates that don't fit in 32 bits are reported as ~0U to 32-bit
+  // callers.
+  rate64 = 1ULL << 40;
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_MAX_PACING_RATE,
+                         &rate64, sizeof(rate64)),
+              SyscallSucceeds());
+  optLen = sizeof(rate32);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_MAX_PACING_RATE,
+                         &rate32, &optLen),
+              SyscallSucceeds());
+  EXPECT_EQ(rate32, ~0U);
+
+  // The 32-bit ~0U means unlimited.
+  rate32 = ~0U;
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_MAX_PACING_RATE,
+                         &rate32, sizeof(rate32)),
+              SyscallSucceeds());
+  optLen = sizeof(rate64);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_MAX_PACING_RATE,
+                         &rate64, &optLen),
+              SyscallSucceeds());
+  EXPECT_EQ(rate64, ~0ULL);
+}
+
+TEST_P(TCPSocketPairTest, BusyPoll) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  // The default is /proc/sys/net/core/busy_read.
+  int opt = -1;
+  socklen_t optLen = sizeof(opt);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_BUSY_POLL, &opt,
+                         &optLen),
+              SyscallSucceeds());
+  EXPECT_EQ(optLen, sizeof(opt));
+  EXPECT_GE(opt, 0);
+
+  opt = -1;
+  EXPECT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_BUSY_POLL, &opt,
+                         sizeof(opt)),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Increasing the busy polling time requires CAP_NET_ADMIN.
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  opt = 1000;
+  ASSERT_THAT(setsockopt(sockets->first_fd(), SOL_SOCKET, SO_BUSY_POLL, &opt,
+                         sizeof(opt)),
+              SyscallSucceeds());
+  opt = 0;
+  optLen = sizeof(opt);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_BUSY_POLL, &opt,
+                         &optLen),
+              SyscallSucceeds());
+  EXPECT_EQ(opt, 1000);
+
+  // Blocking reads still receive data that arrives after busy polling ends.
+  ScopedThread t([&] {
+    absl::SleepFor(absl::Milliseconds(50));
+    char c = 'a';
+    ASSERT_THAT(RetryEINTR(write)(sockets->second_fd(), &c, sizeof(c)),
+                SyscallSucceedsWithValue(sizeof(c)));
+  });
+  char c;
+  ASSERT_THAT(RetryEINTR(recv)(sockets->first_fd(), &c, sizeof(c), 0),
+              SyscallSucceedsWithValue(sizeof(c)));
+  EXPECT_EQ(c, 'a');
+}
+
+TEST_P(TCPSocketPairTest, IncomingCPU) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  char c = 'a';
+  ASSERT_THAT(RetryEINTR(write)(sockets->second_fd(), &c, sizeof(c)),
+              SyscallSucceedsWithValue(sizeof(c)));
+  ASSERT_THAT(RetryEINTR(recv)(sockets->first_fd(), &c, sizeof(c), 0),
+              SyscallSucceedsWithValue(sizeof(c)));
+
+  int cpu = -1;
+  socklen_t optLen = sizeof(cpu);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_INCOMING_CPU,
+                         &cpu, &optLen),
+              SyscallSucceeds());
+  EXPECT_GE(cpu, 0);
+
+  // Packets received without NAPI have no NAPI ID.
+  int napiID = -1;
+  optLen = sizeof(napiID);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_INCOMING_NAPI_ID,
+                         &napiID, &optLen),
+              SyscallSucceeds());
+  EXPECT_EQ(napiID, 0);
+}
+
 // This test validates that an RST is sent instead of a FIN when data is
 // unread on calls to close(2).
 TEST_P(TCPSocketPairTest, RSTSentOnCloseWithUnreadData) {
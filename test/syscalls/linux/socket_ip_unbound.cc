@@ -24,9 +24,18 @@
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
+#include "test/util/capability_util.h"
 #include "test/util/socket_util.h"
 #include "test/util/test_util.h"
 
+#ifndef IPV6_FREEBIND
+#define IPV6_FREEBIND 78
+#endif
+
+#ifndef IPV6_TRANSPARENT
+#define IPV6_TRANSPARENT 75
+#endif
+
 namespace gvisor {
 namespace testing {
 
@@ -453,6 +462,111 @@ TEST_P(IPUnboundSocketTest, SetReuseAddr) {
   EXPECT_EQ(get_sz, sizeof(get));
 }
 
+TEST_P(IPUnboundSocketTest, FreeBindDefault) {
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  int get = -1;
+  socklen_t get_sz = sizeof(get);
+  ASSERT_THAT(
+      getsockopt(socket->get(), IPPROTO_IP, IP_FREEBIND, &get, &get_sz),
+      SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get, kSockOptOff);
+  EXPECT_EQ(get_sz, sizeof(get));
+}
+
+TEST_P(IPUnboundSocketTest, BindNonLocalAddress) {
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  // Addresses from the documentation ranges, which aren't assigned to any
+  // interface.
+  sockaddr_storage addr = {};
+  socklen_t addrlen;
+  int level, optname;
+  if (GetParam().domain == AF_INET) {
+    auto* addr4 = reinterpret_cast<sockaddr_in*>(&addr);
+    addr4->sin_family = AF_INET;
+    ASSERT_EQ(inet_pton(AF_INET, "192.0.2.1", &addr4->sin_addr), 1);
+    addrlen = sizeof(*addr4);
+    level = IPPROTO_IP;
+    optname = IP_FREEBIND;
+  } else {
+    auto* addr6 = reinterpret_cast<sockaddr_in6*>(&addr);
+    addr6->sin6_family = AF_INET6;
+    ASSERT_EQ(inet_pton(AF_INET6, "2001:db8::1", &addr6->sin6_addr), 1);
+    addrlen = sizeof(*addr6);
+    level = IPPROTO_IPV6;
+    optname = IPV6_FREEBIND;
+  }
+
+  EXPECT_THAT(bind(socket->get(), reinterpret_cast<sockaddr*>(&addr), addrlen),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+
+  ASSERT_THAT(setsockopt(socket->get(), level, optname, &kSockOptOn,
+                         sizeof(kSockOptOn)),
+              SyscallSucceeds());
+  int get = -1;
+  socklen_t get_sz = sizeof(get);
+  ASSERT_THAT(getsockopt(socket->get(), level, optname, &get, &get_sz),
+              SyscallSucceeds());
+  EXPECT_EQ(get, kSockOptOn);
+
+  ASSERT_THAT(bind(socket->get(), reinterpret_cast<sockaddr*>(&addr), addrlen),
+              SyscallSucceeds());
+  sockaddr_storage got = {};
+  socklen_t got_len = sizeof(got);
+  ASSERT_THAT(
+      getsockname(socket->get(), reinterpret_cast<sockaddr*>(&got), &got_len),
+      SyscallSucceeds());
+  EXPECT_EQ(got_len, addrlen);
+}
+
+TEST_P(IPUnboundSocketTest, BindNonLocalAddressTransparent) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)) ||
+          !ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  sockaddr_storage addr = {};
+  socklen_t addrlen;
+  int level, optname;
+  if (GetParam().domain == AF_INET) {
+    auto* addr4 = reinterpret_cast<sockaddr_in*>(&addr);
+    addr4->sin_family = AF_INET;
+    ASSERT_EQ(inet_pton(AF_INET, "192.0.2.1", &addr4->sin_addr), 1);
+    addrlen = sizeof(*addr4);
+    level = IPPROTO_IP;
+    optname = IP_TRANSPARENT;
+  } else {
+    auto* addr6 = reinterpret_cast<sockaddr_in6*>(&addr);
+    addr6->sin6_family = AF_INET6;
+    ASSERT_EQ(inet_pton(AF_INET6, "2001:db8::1", &addr6->sin6_addr), 1);
+    addrlen = sizeof(*addr6);
+    level = IPPROTO_IPV6;
+    optname = IPV6_TRANSPARENT;
+  }
+
+  // Setting the option requires CAP_NET_ADMIN or CAP_NET_RAW.
+  {
+    AutoCapability no_admin(CAP_NET_ADMIN, false);
+    AutoCapability no_raw(CAP_NET_RAW, false);
+    EXPECT_THAT(setsockopt(socket->get(), level, optname, &kSockOptOn,
+                           sizeof(kSockOptOn)),
+                SyscallFailsWithErrno(EPERM));
+  }
+
+  ASSERT_THAT(setsockopt(socket->get(), level, optname, &kSockOptOn,
+                         sizeof(kSockOptOn)),
+              SyscallSucceeds());
+  int get = -1;
+  socklen_t get_sz = sizeof(get);
+  ASSERT_THAT(getsockopt(socket->get(), level, optname, &get, &get_sz),
+              SyscallSucceeds());
+  EXPECT_EQ(get, kSockOptOn);
+
+  ASSERT_THAT(bind(socket->get(), reinterpret_cast<sockaddr*>(&addr), addrlen),
+              SyscallSucceeds());
+}
+
 INSTANTIATE_TEST_SUITE_P(
     IPUnboundSockets, IPUnboundSocketTest,
     ::testing::ValuesIn(VecCat<SocketKind>(
@@ -330,6 +330,55 @@ TEST(NetlinkRouteTest, RemoveLoopbackByIndex) {
               PosixErrorIs(ENOTSUP, _));
 }
 
+TEST(NetlinkRouteTest, SetLoopbackUp) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  Link loopback_link = ASSERT_NO_ERRNO_AND_VALUE(LoopbackLink());
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_ROUTE));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct ifinfomsg ifm;
+  };
+
+  // The loopback interface is already up, so this doesn't change anything.
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = RTM_NEWLINK;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST;
+  req.hdr.nlmsg_seq = kSeq;
+  req.ifm.ifi_family = AF_UNSPEC;
+  req.ifm.ifi_index = loopback_link.index;
+  req.ifm.ifi_flags = IFF_UP;
+  req.ifm.ifi_change = IFF_UP;
+
+  EXPECT_NO_ERRNO(NetlinkRequestAckOrError(fd, kSeq, &req, sizeof(req)));
+}
+
+TEST(NetlinkRouteTest, SetLinkByIndexNotFound) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_ROUTE));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct ifinfomsg ifm;
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = RTM_NEWLINK;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST;
+  req.hdr.nlmsg_seq = kSeq;
+  req.ifm.ifi_family = AF_UNSPEC;
+  req.ifm.ifi_index = 1234590;
+  req.ifm.ifi_flags = IFF_UP;
+  req.ifm.ifi_change = IFF_UP;
+
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, kSeq, &req, sizeof(req)),
+              PosixErrorIs(ENODEV, _));
+}
+
 TEST(NetlinkRouteTest, RemoveLinkByIndexNotFound) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
   FileDescriptor fd =
@@ -815,6 +864,144 @@ TEST(NetlinkRouteTest, GetRouteRequest) {
   EXPECT_TRUE(rtDstFound);
 }
 
+// ModifyRoute sends an RTM_NEWROUTE or RTM_DELROUTE request for the IPv4 route
+// dst/dst_len via the interface index with the given priority.
+PosixError ModifyRoute(uint16_t type, uint16_t flags, int index,
+                       const struct in_addr& dst, int dst_len,
+                       uint32_t priority) {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor fd, NetlinkBoundSocket(NETLINK_ROUTE));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct rtmsg rtm;
+    char attrbuf[512];
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = NLMSG_LENGTH(sizeof(req.rtm));
+  req.hdr.nlmsg_type = type;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_ACK | flags;
+  req.hdr.nlmsg_seq = kSeq;
+  req.rtm.rtm_family = AF_INET;
+  req.rtm.rtm_dst_len = dst_len;
+  req.rtm.rtm_table = RT_TABLE_MAIN;
+  req.rtm.rtm_protocol = RTPROT_BOOT;
+  req.rtm.rtm_scope = RT_SCOPE_LINK;
+  req.rtm.rtm_type = RTN_UNICAST;
+
+  auto add_attr = [&req](uint16_t attr_type, const void* data, int len) {
+    struct rtattr* rta = reinterpret_cast<struct rtattr*>(
+        reinterpret_cast<int8_t*>(&req) + NLMSG_ALIGN(req.hdr.nlmsg_len));
+    rta->rta_type = attr_type;
+    rta->rta_len = RTA_LENGTH(len);
+    memcpy(RTA_DATA(rta), data, len);
+    req.hdr.nlmsg_len = NLMSG_ALIGN(req.hdr.nlmsg_len) + RTA_LENGTH(len);
+  };
+  add_attr(RTA_DST, &dst, sizeof(dst));
+  add_attr(RTA_OIF, &index, sizeof(index));
+  add_attr(RTA_PRIORITY, &priority, sizeof(priority));
+
+  return NetlinkRequestAckOrError(fd, kSeq, &req, req.hdr.nlmsg_len);
+}
+
+// FindRoute returns the priority of the IPv4 route dst/dst_len in the main
+// route table. ENOENT if not found.
+PosixErrorOr<uint32_t> FindRoute(const struct in_addr& dst, int dst_len) {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor fd, NetlinkBoundSocket(NETLINK_ROUTE));
+
+  struct request {
+    struct nlmsghdr hdr;
+    struct rtmsg rtm;
+  };
+
+  struct request req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = RTM_GETROUTE;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  req.hdr.nlmsg_seq = kSeq;
+  req.rtm.rtm_family = AF_INET;
+
+  bool found = false;
+  uint32_t priority = 0;
+  RETURN_IF_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != RTM_NEWROUTE) {
+          return;
+        }
+        const struct rtmsg* msg =
+            reinterpret_cast<const struct rtmsg*>(NLMSG_DATA(hdr));
+        if (msg->rtm_table != RT_TABLE_MAIN || msg->rtm_dst_len != dst_len) {
+          return;
+        }
+        bool dst_match = false;
+        uint32_t prio = 0;
+        int len = RTM_PAYLOAD(hdr);
+        for (struct rtattr* attr = RTM_RTA(msg); RTA_OK(attr, len);
+             attr = RTA_NEXT(attr, len)) {
+          if (attr->rta_type == RTA_DST) {
+            dst_match = memcmp(RTA_DATA(attr), &dst, sizeof(dst)) == 0;
+          } else if (attr->rta_type == RTA_PRIORITY) {
+            memcpy(&prio, RTA_DATA(attr), sizeof(prio));
+          }
+        }
+        if (dst_match) {
+          found = true;
+          priority = prio;
+        }
+      },
+      false));
+  if (!found) {
+    return PosixError(ENOENT, "route not found");
+  }
+  return priority;
+}
+
+TEST(NetlinkRouteTest, AddAndRemoveRoute) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  // Don't do cooperative save/restore because netstack state is not restored.
+  // TODO(gvisor.dev/issue/4595): enable cooperative save tests.
+  const DisableSave ds;
+
+  Link loopback_link = ASSERT_NO_ERRNO_AND_VALUE(LoopbackLink());
+
+  struct in_addr dst;
+  ASSERT_EQ(inet_pton(AF_INET, "10.42.0.0", &dst), 1);
+
+  ASSERT_NO_ERRNO(ModifyRoute(RTM_NEWROUTE, NLM_F_CREATE | NLM_F_EXCL,
+                              loopback_link.index, dst, 16,
+                              /*priority=*/100));
+  EXPECT_THAT(FindRoute(dst, 16), IsPosixErrorOkAndHolds(100));
+
+  // Adding the same route again must fail with NLM_F_EXCL.
+  EXPECT_THAT(ModifyRoute(RTM_NEWROUTE, NLM_F_CREATE | NLM_F_EXCL,
+                          loopback_link.index, dst, 16, /*priority=*/100),
+              PosixErrorIs(EEXIST, _));
+
+  // Replacing a route that doesn't exist without NLM_F_CREATE fails.
+  EXPECT_THAT(ModifyRoute(RTM_NEWROUTE, NLM_F_REPLACE, loopback_link.index,
+                          dst, 16, /*priority=*/200),
+              PosixErrorIs(ENOENT, _));
+
+  // Routes with a different priority are distinct.
+  ASSERT_NO_ERRNO(ModifyRoute(RTM_NEWROUTE, NLM_F_CREATE | NLM_F_EXCL,
+                              loopback_link.index, dst, 16,
+                              /*priority=*/50));
+  EXPECT_THAT(FindRoute(dst, 16), IsPosixErrorOkAndHolds(AnyOf(50, 100)));
+
+  ASSERT_NO_ERRNO(ModifyRoute(RTM_DELROUTE, 0, loopback_link.index, dst, 16,
+                              /*priority=*/50));
+  EXPECT_THAT(FindRoute(dst, 16), IsPosixErrorOkAndHolds(100));
+  ASSERT_NO_ERRNO(ModifyRoute(RTM_DELROUTE, 0, loopback_link.index, dst, 16,
+                              /*priority=*/100));
+  EXPECT_THAT(FindRoute(dst, 16), PosixErrorIs(ENOENT, _));
+
+  // The route no longer exists.
+  EXPECT_THAT(ModifyRoute(RTM_DELROUTE, 0, loopback_link.index, dst, 16,
+                          /*priority=*/100),
+              PosixErrorIs(ESRCH, _));
+}
+
 // RecvmsgTrunc tests the recvmsg MSG_TRUNC flag with zero length output
 // buffer. MSG_TRUNC with a zero length buffer should consume subsequent
 // messages off the socket.
@@ -15,6 +15,7 @@
 #include "test/syscalls/linux/socket_unix_seqpacket.h"
 
 #include <stdio.h>
+#include <string.h>
 #include <sys/un.h>
 
 #include "gtest/gtest.h"
@@ -63,6 +64,51 @@ TEST_P(SeqpacketUnixSocketPairTest, Sendto) {
               SyscallSucceedsWithValue(3));
 }
 
+TEST_P(SeqpacketUnixSocketPairTest, PeekOffset) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  int off = 1;
+  ASSERT_THAT(setsockopt(sockets->second_fd(), SOL_SOCKET, SO_PEEK_OFF, &off,
+                         sizeof(off)),
+              SyscallSucceeds());
+
+  ASSERT_THAT(RetryEINTR(write)(sockets->first_fd(), "abc", 3),
+              SyscallSucceedsWithValue(3));
+  ASSERT_THAT(RetryEINTR(write)(sockets->first_fd(), "defg", 4),
+              SyscallSucceedsWithValue(4));
+
+  // Peeking starts within the first message, and messages are truncated at
+  // their end.
+  char buf[8] = {};
+  struct iovec iov = {buf, 1};
+  struct msghdr msg = {};
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  ASSERT_THAT(RetryEINTR(recvmsg)(sockets->second_fd(), &msg, MSG_PEEK),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(buf[0], 'b');
+  EXPECT_EQ(msg.msg_flags & MSG_TRUNC, MSG_TRUNC);
+
+  // The offset may move on to the next message.
+  ASSERT_THAT(
+      RetryEINTR(recv)(sockets->second_fd(), buf, sizeof(buf), MSG_PEEK),
+      SyscallSucceedsWithValue(1));
+  EXPECT_EQ(buf[0], 'c');
+  ASSERT_THAT(
+      RetryEINTR(recv)(sockets->second_fd(), buf, sizeof(buf), MSG_PEEK),
+      SyscallSucceedsWithValue(4));
+  EXPECT_EQ(memcmp(buf, "defg", 4), 0);
+
+  // Consuming a message moves the offset back by its length.
+  ASSERT_THAT(RetryEINTR(recv)(sockets->second_fd(), buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(3));
+  socklen_t len = sizeof(off);
+  ASSERT_THAT(
+      getsockopt(sockets->second_fd(), SOL_SOCKET, SO_PEEK_OFF, &off, &len),
+      SyscallSucceeds());
+  EXPECT_EQ(off, 4);
+}
+
 TEST_P(SeqpacketUnixSocketPairTest, IncreasedSocketSendBufUnblocksWrites) {
   auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
   int sock = sockets->first_fd();
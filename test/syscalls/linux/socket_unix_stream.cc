@@ -14,6 +14,7 @@
 
 #include <poll.h>
 #include <stdio.h>
+#include <string.h>
 #include <sys/un.h>
 
 #include "gtest/gtest.h"
@@ -229,6 +230,97 @@ TEST_P(StreamUnixSocketPairTest, IncreasedSocketSendBufUnblocksWrites) {
               SyscallSucceeds());
 }
 
+TEST_P(StreamUnixSocketPairTest, PeerCred) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  // Both ends were created by this process, so they report its credentials.
+  for (int fd : {sockets->first_fd(), sockets->second_fd()}) {
+    struct ucred cred = {};
+    socklen_t len = sizeof(cred);
+    ASSERT_THAT(getsockopt(fd, SOL_SOCKET, SO_PEERCRED, &cred, &len),
+                SyscallSucceeds());
+    EXPECT_EQ(len, sizeof(cred));
+    EXPECT_EQ(cred.pid, getpid());
+    EXPECT_EQ(cred.uid, geteuid());
+    EXPECT_EQ(cred.gid, getegid());
+  }
+}
+
+TEST_P(StreamUnixSocketPairTest, PeekOffset) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+
+  // SO_PEEK_OFF is disabled by default.
+  int off = 0;
+  socklen_t len = sizeof(off);
+  ASSERT_THAT(
+      getsockopt(sockets->second_fd(), SOL_SOCKET, SO_PEEK_OFF, &off, &len),
+      SyscallSucceeds());
+  EXPECT_EQ(off, -1);
+
+  off = 0;
+  ASSERT_THAT(setsockopt(sockets->second_fd(), SOL_SOCKET, SO_PEEK_OFF, &off,
+                         sizeof(off)),
+              SyscallSucceeds());
+
+  // Write in two parts, so that peeking crosses them.
+  constexpr char kStr[] = "abcdef";
+  ASSERT_THAT(RetryEINTR(write)(sockets->first_fd(), kStr, 2),
+              SyscallSucceedsWithValue(2));
+  ASSERT_THAT(RetryEINTR(write)(sockets->first_fd(), kStr + 2, 4),
+              SyscallSucceedsWithValue(4));
+
+  // Successive peeks advance through the data.
+  char buf[3] = {};
+  ASSERT_THAT(RetryEINTR(recv)(sockets->second_fd(), buf, 1, MSG_PEEK),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(buf[0], 'a');
+  ASSERT_THAT(RetryEINTR(recv)(sockets->second_fd(), buf, 1, MSG_PEEK),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(buf[0], 'b');
+  ASSERT_THAT(RetryEINTR(recv)(sockets->second_fd(), buf, 2, MSG_PEEK),
+              SyscallSucceedsWithValue(2));
+  EXPECT_EQ(memcmp(buf, "cd", 2), 0);
+  len = sizeof(off);
+  ASSERT_THAT(
+      getsockopt(sockets->second_fd(), SOL_SOCKET, SO_PEEK_OFF, &off, &len),
+      SyscallSucceeds());
+  EXPECT_EQ(off, 4);
+
+  // Consuming data moves the offset back.
+  ASSERT_THAT(RetryEINTR(recv)(sockets->second_fd(), buf, 3, 0),
+              SyscallSucceedsWithValue(3));
+  EXPECT_EQ(memcmp(buf, "abc", 3), 0);
+  ASSERT_THAT(
+      getsockopt(sockets->second_fd(), SOL_SOCKET, SO_PEEK_OFF, &off, &len),
+      SyscallSucceeds());
+  EXPECT_EQ(off, 1);
+  ASSERT_THAT(RetryEINTR(recv)(sockets->second_fd(), buf, 2, MSG_PEEK),
+              SyscallSucceedsWithValue(2));
+  EXPECT_EQ(memcmp(buf, "ef", 2), 0);
+
+  // There is no data left past the offset.
+  ASSERT_THAT(recv(sockets->second_fd(), buf, 1, MSG_PEEK | MSG_DONTWAIT),
+              SyscallFailsWithErrno(EAGAIN));
+
+  // Data is still read from the front of the queue.
+  ASSERT_THAT(RetryEINTR(recv)(sockets->second_fd(), buf, 3, 0),
+              SyscallSucceedsWithValue(3));
+  EXPECT_EQ(memcmp(buf, "def", 3), 0);
+}
+
+TEST(StreamUnixSocketTest, PeerCredUnconnected) {
+  FileDescriptor sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_UNIX, SOCK_STREAM, 0));
+
+  struct ucred cred = {};
+  socklen_t len = sizeof(cred);
+  ASSERT_THAT(getsockopt(sock.get(), SOL_SOCKET, SO_PEERCRED, &cred, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(cred.pid, 0);
+  EXPECT_EQ(cred.uid, static_cast<uid_t>(-1));
+  EXPECT_EQ(cred.gid, static_cast<gid_t>(-1));
+}
+
 INSTANTIATE_TEST_SUITE_P(
     AllUnixDomainSockets, StreamUnixSocketPairTest,
     ::testing::ValuesIn(IncludeReversals(VecCat<SocketPairKind>(
@@ -17,6 +17,7 @@
 #include <sys/stat.h>
 #include <sys/statfs.h>
 #include <sys/types.h>
+#include <time.h>
 #include <unistd.h>
 
 #include <string>
@@ -644,6 +645,10 @@ TEST(SimpleStatTest, AnonDeviceAllocatesUniqueInodesAcrossSaveRestore) {
 #define STATX_ALL 0x00000fffU
 #endif  // STATX_ALL
 
+#ifndef STATX_BTIME
+#define STATX_BTIME 0x00000800U
+#endif  // STATX_BTIME
+
 // struct kernel_statx_timestamp is a Linux statx_timestamp struct.
 struct kernel_statx_timestamp {
   int64_t tv_sec;
@@ -769,6 +774,36 @@ TEST_F(StatTest, StatxSymlink) {
   EXPECT_TRUE(S_ISREG(stx.stx_mode));
 }
 
+TEST_F(StatTest, StatxBtime) {
+  SKIP_IF(!IsRunningOnGvisor() && statx(-1, nullptr, 0, 0, nullptr) < 0 &&
+          errno == ENOSYS);
+
+  struct kernel_statx stx;
+  ASSERT_THAT(statx(AT_FDCWD, test_file_name_.c_str(), 0, STATX_BTIME, &stx),
+              SyscallSucceeds());
+  // Not all filesystems support btime, but if it is reported, it must be set.
+  if (stx.stx_mask & STATX_BTIME) {
+    EXPECT_GT(stx.stx_btime.tv_sec, 0);
+    EXPECT_LE(stx.stx_btime.tv_sec, time(nullptr));
+  }
+}
+
+TEST_F(StatTest, StatxDontSync) {
+  SKIP_IF(!IsRunningOnGvisor() && statx(-1, nullptr, 0, 0, nullptr) < 0 &&
+          errno == ENOSYS);
+
+  struct kernel_statx stx;
+  ASSERT_THAT(statx(AT_FDCWD, test_file_name_.c_str(), AT_STATX_DONT_SYNC,
+                    STATX_ALL, &stx),
+              SyscallSucceeds());
+  EXPECT_TRUE(S_ISREG(stx.stx_mode));
+
+  struct stat st;
+  ASSERT_THAT(stat(test_file_name_.c_str(), &st), SyscallSucceeds());
+  EXPECT_EQ(stx.stx_ino, st.st_ino);
+  EXPECT_EQ(stx.stx_size, st.st_size);
+}
+
 TEST_F(StatTest, StatxInvalidFlags) {
   SKIP_IF(!IsRunningOnGvisor() && statx(-1, nullptr, 0, 0, nullptr) < 0 &&
           errno == ENOSYS);
@@ -14,6 +14,7 @@
 
 #include <fcntl.h>
 #ifdef __linux__
+#include <linux/errqueue.h>
 #include <linux/filter.h>
 #endif  // __linux__
 #include <netinet/in.h>
@@ -848,6 +849,109 @@ TEST_P(TcpSocketTest, TimeWaitPollHUP) {
   ASSERT_THAT(poll(&pfd, 1, kTimeoutMillis), SyscallSucceedsWithValue(1));
 }
 
+#ifdef __linux__
+TEST_P(TcpSocketTest, ZeroCopyOption) {
+  int v = -1;
+  socklen_t optlen = sizeof(v);
+  ASSERT_THAT(
+      getsockopt(connected_.get(), SOL_SOCKET, SO_ZEROCOPY, &v, &optlen),
+      SyscallSucceeds());
+  EXPECT_EQ(v, 0);
+
+  v = 1;
+  ASSERT_THAT(
+      setsockopt(connected_.get(), SOL_SOCKET, SO_ZEROCOPY, &v, sizeof(v)),
+      SyscallSucceeds());
+  v = -1;
+  ASSERT_THAT(
+      getsockopt(connected_.get(), SOL_SOCKET, SO_ZEROCOPY, &v, &optlen),
+      SyscallSucceeds());
+  EXPECT_EQ(v, 1);
+}
+
+TEST_P(TcpSocketTest, MsgZeroCopyIgnoredWithoutOption) {
+  char buf[1024] = {};
+  ASSERT_THAT(RetryEINTR(send)(connected_.get(), buf, sizeof(buf),
+                               MSG_ZEROCOPY),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  ASSERT_THAT(RetryEINTR(recv)(accepted_.get(), buf, sizeof(buf), MSG_WAITALL),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  char cbuf[CMSG_SPACE(sizeof(sock_extended_err) + sizeof(sockaddr_in6))];
+  struct msghdr msg = {};
+  msg.msg_control = cbuf;
+  msg.msg_controllen = sizeof(cbuf);
+  EXPECT_THAT(recvmsg(connected_.get(), &msg, MSG_ERRQUEUE),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+TEST_P(TcpSocketTest, MsgZeroCopyCompletions) {
+  constexpr int kSends = 3;
+  int v = 1;
+  ASSERT_THAT(
+      setsockopt(connected_.get(), SOL_SOCKET, SO_ZEROCOPY, &v, sizeof(v)),
+      SyscallSucceeds());
+
+  std::vector<char> buf(1 << 16);
+  for (int i = 0; i < kSends; i++) {
+    ASSERT_THAT(RetryEINTR(send)(connected_.get(), buf.data(), buf.size(),
+                                 MSG_ZEROCOPY),
+                SyscallSucceedsWithValue(buf.size()));
+  }
+  for (int i = 0; i < kSends; i++) {
+    ASSERT_THAT(RetryEINTR(recv)(accepted_.get(), buf.data(), buf.size(),
+                                 MSG_WAITALL),
+                SyscallSucceedsWithValue(buf.size()));
+  }
+
+  // Completions may be coalesced, so collect them until all sends have been
+  // notified.
+  uint32_t next = 0;
+  while (next < kSends) {
+    struct pollfd pfd = {
+        .fd = connected_.get(),
+        .events = 0,
+    };
+    ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, kTimeoutMillis),
+                SyscallSucceedsWithValue(1));
+    ASSERT_EQ(pfd.revents & POLLERR, POLLERR);
+
+    char cbuf[CMSG_SPACE(sizeof(sock_extended_err) + sizeof(sockaddr_in6))];
+    struct msghdr msg = {};
+    msg.msg_control = cbuf;
+    msg.msg_controllen = sizeof(cbuf);
+    ASSERT_THAT(recvmsg(connected_.get(), &msg, MSG_ERRQUEUE),
+                SyscallSucceedsWithValue(0));
+
+    struct cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+    ASSERT_NE(cmsg, nullptr);
+    if (GetParam() == AF_INET) {
+      EXPECT_EQ(cmsg->cmsg_level, SOL_IP);
+      EXPECT_EQ(cmsg->cmsg_type, IP_RECVERR);
+    } else {
+      EXPECT_EQ(cmsg->cmsg_level, SOL_IPV6);
+      EXPECT_EQ(cmsg->cmsg_type, IPV6_RECVERR);
+    }
+    sock_extended_err ee;
+    memcpy(&ee, CMSG_DATA(cmsg), sizeof(ee));
+    EXPECT_EQ(ee.ee_errno, 0);
+    EXPECT_EQ(ee.ee_origin, SO_EE_ORIGIN_ZEROCOPY);
+    // ee_info and ee_data are the first and last IDs of the completed sends.
+    ASSERT_EQ(ee.ee_info, next);
+    ASSERT_GE(ee.ee_data, ee.ee_info);
+    next = ee.ee_data + 1;
+  }
+  EXPECT_EQ(next, kSends);
+
+  char cbuf[CMSG_SPACE(sizeof(sock_extended_err) + sizeof(sockaddr_in6))];
+  struct msghdr msg = {};
+  msg.msg_control = cbuf;
+  msg.msg_controllen = sizeof(cbuf);
+  EXPECT_THAT(recvmsg(connected_.get(), &msg, MSG_ERRQUEUE),
+              SyscallFailsWithErrno(EAGAIN));
+}
+#endif  // __linux__
+
 INSTANTIATE_TEST_SUITE_P(AllInetTests, TcpSocketTest,
                          ::testing::Values(AF_INET, AF_INET6));
 
@@ -1994,10 +2098,36 @@ TEST_P(SimpleTcpSocketTest, SetTCPWindowClampAboveHalfMinRcvBuf) {
   }
 }
 
+TEST_P(SimpleTcpSocketTest, SetTCPMD5Sig) {
+  FileDescriptor s =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(GetParam(), SOCK_STREAM, IPPROTO_TCP));
+
+  struct tcp_md5sig md5 = {};
+  md5.tcpm_addr = ASSERT_NO_ERRNO_AND_VALUE(InetLoopbackAddr(GetParam()));
+  constexpr char kKey[] = "secret";
+  md5.tcpm_keylen = sizeof(kKey) - 1;
+  memcpy(md5.tcpm_key, kKey, md5.tcpm_keylen);
+  EXPECT_THAT(setsockopt(s.get(), IPPROTO_TCP, TCP_MD5SIG, &md5, sizeof(md5)),
+              SyscallSucceeds());
+
+  // A zero key length deletes the key.
+  md5.tcpm_keylen = 0;
+  EXPECT_THAT(setsockopt(s.get(), IPPROTO_TCP, TCP_MD5SIG, &md5, sizeof(md5)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(s.get(), IPPROTO_TCP, TCP_MD5SIG, &md5, sizeof(md5)),
+              SyscallFailsWithErrno(ENOENT));
+
+  md5.tcpm_keylen = TCP_MD5SIG_MAXKEYLEN + 1;
+  EXPECT_THAT(setsockopt(s.get(), IPPROTO_TCP, TCP_MD5SIG, &md5, sizeof(md5)),
+              SyscallFailsWithErrno(EINVAL));
+
+  EXPECT_THAT(
+      setsockopt(s.get(), IPPROTO_TCP, TCP_MD5SIG, &md5, sizeof(md5) - 1),
+      SyscallFailsWithErrno(EINVAL));
+}
+
 #ifdef __linux__
 
-// TODO(gvisor.dev/2746): Support SO_ATTACH_FILTER/SO_DETACH_FILTER.
-// gVisor currently silently ignores attaching a filter.
 TEST_P(SimpleTcpSocketTest, SetSocketAttachDetachFilter) {
   FileDescriptor s =
       ASSERT_NO_ERRNO_AND_VALUE(Socket(GetParam(), SOCK_STREAM, IPPROTO_TCP));
@@ -2031,8 +2161,6 @@ TEST_P(SimpleTcpSocketTest, SetSocketAttachDetachFilter) {
 #endif  // __linux__
 
 TEST_P(SimpleTcpSocketTest, SetSocketDetachFilterNoInstalledFilter) {
-  // TODO(gvisor.dev/2746): Support SO_ATTACH_FILTER/SO_DETACH_FILTER.
-  SKIP_IF(IsRunningOnGvisor());
   FileDescriptor s =
       ASSERT_NO_ERRNO_AND_VALUE(Socket(GetParam(), SOCK_STREAM, IPPROTO_TCP));
   constexpr int val = 0;
@@ -0,0 +1,194 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <fcntl.h>
+#include <poll.h>
+#include <sched.h>
+#include <stdint.h>
+#include <string.h>
+#include <sys/timerfd.h>
+#include <sys/wait.h>
+#include <time.h>
+#include <unistd.h>
+
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/logging.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/posix_error.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+#ifndef CLONE_NEWTIME
+#define CLONE_NEWTIME 0x00000080
+#endif
+
+constexpr char kOffsetsPath[] = "/proc/self/timens_offsets";
+
+constexpr int64_t kMonotonicOffsetSecs = 86400;
+constexpr int64_t kBoottimeOffsetSecs = 2 * 86400;
+
+int64_t ClockSecs(clockid_t clock) {
+  struct timespec ts;
+  TEST_CHECK_SUCCESS(clock_gettime(clock, &ts));
+  return ts.tv_sec;
+}
+
+TEST(TimeNamespaceTest, DefaultOffsets) {
+  SKIP_IF(access(kOffsetsPath, F_OK) != 0);
+
+  std::string contents = ASSERT_NO_ERRNO_AND_VALUE(GetContents(kOffsetsPath));
+  EXPECT_EQ(contents,
+            "monotonic           0         0\n"
+            "boottime            0         0\n");
+}
+
+TEST(TimeNamespaceTest, WriteRequiresCapSysTime) {
+  SKIP_IF(access(kOffsetsPath, F_OK) != 0);
+  SKIP_IF(ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_TIME)));
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kOffsetsPath, O_WRONLY));
+  constexpr char kOffsets[] = "monotonic 1 0\n";
+  EXPECT_THAT(write(fd.get(), kOffsets, sizeof(kOffsets) - 1),
+              SyscallFailsWithErrno(EPERM));
+}
+
+TEST(TimeNamespaceTest, ChildSeesOffsets) {
+  SKIP_IF(access(kOffsetsPath, F_OK) != 0);
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)) ||
+          !ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_TIME)));
+
+  const int64_t monotonic = ClockSecs(CLOCK_MONOTONIC);
+  const int64_t boottime = ClockSecs(CLOCK_BOOTTIME);
+
+  EXPECT_THAT(InForkedProcess([&] {
+                TEST_CHECK_SUCCESS(unshare(CLONE_NEWTIME));
+
+                // The caller stays in its time namespace, but the offsets of
+                // the new one are shown and may be set.
+                int fd = open(kOffsetsPath, O_WRONLY);
+                TEST_CHECK_SUCCESS(fd);
+                const std::string offsets =
+                    absl::StrCat("monotonic ", kMonotonicOffsetSecs,
+                                 " 0\nboottime ", kBoottimeOffsetSecs, " 0\n");
+                TEST_CHECK(write(fd, offsets.data(), offsets.size()) ==
+                           static_cast<ssize_t>(offsets.size()));
+                TEST_CHECK(ClockSecs(CLOCK_MONOTONIC) <
+                           monotonic + kMonotonicOffsetSecs);
+
+                // Children enter the new namespace.
+                pid_t child = fork();
+                if (child == 0) {
+                  TEST_CHECK(ClockSecs(CLOCK_MONOTONIC) >=
+                             monotonic + kMonotonicOffsetSecs);
+                  TEST_CHECK(ClockSecs(CLOCK_BOOTTIME) >=
+                             boottime + kBoottimeOffsetSecs);
+                  _exit(0);
+                }
+                TEST_CHECK_SUCCESS(child);
+                int status;
+                TEST_CHECK(waitpid(child, &status, 0) == child);
+                TEST_CHECK(WIFEXITED(status) && WEXITSTATUS(status) == 0);
+
+                // The offsets are frozen once a task has entered the
+                // namespace.
+                TEST_CHECK_ERRNO(write(fd, offsets.data(), offsets.size()),
+                                 EACCES);
+                close(fd);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+TEST(TimeNamespaceTest, InvalidOffsets) {
+  SKIP_IF(access(kOffsetsPath, F_OK) != 0);
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)) ||
+          !ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_TIME)));
+
+  EXPECT_THAT(InForkedProcess([&] {
+                TEST_CHECK_SUCCESS(unshare(CLONE_NEWTIME));
+                int fd = open(kOffsetsPath, O_WRONLY);
+                TEST_CHECK_SUCCESS(fd);
+                for (const char* offsets :
+                     {"realtime 1 0\n", "monotonic 1 1000000000\n",
+                      "monotonic 1\n"}) {
+                  TEST_CHECK_ERRNO(write(fd, offsets, strlen(offsets)),
+                                   EINVAL);
+                }
+                // The clock may not become negative.
+                const std::string negative =
+                    absl::StrCat("monotonic -",
+                                 ClockSecs(CLOCK_MONOTONIC) + 10, " 0\n");
+                TEST_CHECK_ERRNO(write(fd, negative.data(), negative.size()),
+                                 ERANGE);
+                close(fd);
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+// Setting CLOCK_REALTIME only affects the sandbox, so it is only tested in
+// gVisor.
+TEST(TimeNamespaceTest, SetRealtimeInSandbox) {
+  SKIP_IF(!IsRunningOnGvisor());
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_TIME)));
+
+  struct timespec before;
+  ASSERT_THAT(clock_gettime(CLOCK_REALTIME, &before), SyscallSucceeds());
+
+  // Arm a timer an hour from now.
+  int fd;
+  ASSERT_THAT(fd = timerfd_create(CLOCK_REALTIME, TFD_NONBLOCK),
+              SyscallSucceeds());
+  FileDescriptor tfd(fd);
+  struct itimerspec its = {};
+  its.it_value.tv_sec = before.tv_sec + 3600;
+  ASSERT_THAT(timerfd_settime(tfd.get(), TFD_TIMER_ABSTIME, &its, nullptr),
+              SyscallSucceeds());
+
+  // Move the clock two hours forward.
+  struct timespec later = before;
+  later.tv_sec += 7200;
+  ASSERT_THAT(clock_settime(CLOCK_REALTIME, &later), SyscallSucceeds());
+  struct timespec now;
+  ASSERT_THAT(clock_gettime(CLOCK_REALTIME, &now), SyscallSucceeds());
+  EXPECT_GE(now.tv_sec, later.tv_sec);
+  EXPECT_LT(now.tv_sec, later.tv_sec + 60);
+
+  // The timer expires once it notices the change.
+  struct pollfd pfd = {.fd = tfd.get(), .events = POLLIN};
+  EXPECT_THAT(RetryEINTR(poll)(&pfd, 1, 5000), SyscallSucceedsWithValue(1));
+
+  // Other clocks are unaffected.
+  EXPECT_THAT(clock_settime(CLOCK_MONOTONIC, &later),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Restore the clock.
+  ASSERT_THAT(clock_gettime(CLOCK_REALTIME, &now), SyscallSucceeds());
+  now.tv_sec -= 7200;
+  ASSERT_THAT(clock_settime(CLOCK_REALTIME, &now), SyscallSucceeds());
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -19,6 +19,7 @@
 
 #include "absl/time/clock.h"
 #include "absl/time/time.h"
+#include "test/util/capability_util.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/posix_error.h"
 #include "test/util/test_util.h"
@@ -263,6 +264,34 @@ TEST(TimerfdClockRealtimeTest, ClockRealtime) {
   EXPECT_EQ(1, val);
 }
 
+TEST(TimerfdAlarmTest, RequiresCapWakeAlarm) {
+  AutoCapability cap(CAP_WAKE_ALARM, false);
+  EXPECT_THAT(timerfd_create(CLOCK_REALTIME_ALARM, 0),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(timerfd_create(CLOCK_BOOTTIME_ALARM, 0),
+              SyscallFailsWithErrno(EPERM));
+}
+
+TEST(TimerfdAlarmTest, ClockBoottimeAlarm) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_WAKE_ALARM)));
+
+  constexpr absl::Duration kDelay = absl::Seconds(1);
+
+  auto const tfd =
+      ASSERT_NO_ERRNO_AND_VALUE(TimerfdCreate(CLOCK_BOOTTIME_ALARM, 0));
+  struct itimerspec its = {};
+  its.it_value = absl::ToTimespec(kDelay);
+  auto const start_time = absl::Now();
+  ASSERT_THAT(timerfd_settime(tfd.get(), /* flags = */ 0, &its, nullptr),
+              SyscallSucceeds());
+
+  uint64_t val = 0;
+  ASSERT_THAT(ReadFd(tfd.get(), &val, sizeof(uint64_t)),
+              SyscallSucceedsWithValue(sizeof(uint64_t)));
+  EXPECT_EQ(1, val);
+  EXPECT_GE(absl::Now() - start_time, kDelay - TimerSlack());
+}
+
 }  // namespace
 
 }  // namespace testing
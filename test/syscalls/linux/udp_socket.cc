@@ -17,6 +17,7 @@
 #include <netinet/icmp6.h>
 #include <netinet/ip_icmp.h>
 
+#include <algorithm>
 #include <ctime>
 #include <utility>
 #include <vector>
@@ -24,8 +25,10 @@
 #ifdef __linux__
 #include <linux/errqueue.h>
 #include <linux/filter.h>
+#include <linux/net_tstamp.h>
 #endif  // __linux__
 #include <netinet/in.h>
+#include <netinet/udp.h>
 #include <poll.h>
 #include <sys/ioctl.h>
 #include <sys/socket.h>
@@ -48,6 +51,13 @@
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
 
+#ifndef UDP_SEGMENT
+#define UDP_SEGMENT 103
+#endif
+#ifndef UDP_GRO
+#define UDP_GRO 104
+#endif
+
 namespace gvisor {
 namespace testing {
 
@@ -1693,6 +1703,123 @@ TEST_P(UdpSocketTest, WriteShutdownNotConnected) {
   EXPECT_THAT(shutdown(bind_.get(), SHUT_WR), SyscallFailsWithErrno(ENOTCONN));
 }
 
+#ifdef __linux__
+TEST_P(UdpSocketTest, SoTimestampingRX) {
+  ASSERT_NO_ERRNO(BindLoopback());
+  ASSERT_THAT(connect(sock_.get(), bind_addr_, addrlen_), SyscallSucceeds());
+
+  int v = SOF_TIMESTAMPING_RX_SOFTWARE | SOF_TIMESTAMPING_SOFTWARE;
+  ASSERT_THAT(
+      setsockopt(bind_.get(), SOL_SOCKET, SO_TIMESTAMPING, &v, sizeof(v)),
+      SyscallSucceeds());
+  int got = 0;
+  socklen_t optlen = sizeof(got);
+  ASSERT_THAT(
+      getsockopt(bind_.get(), SOL_SOCKET, SO_TIMESTAMPING, &got, &optlen),
+      SyscallSucceeds());
+  EXPECT_EQ(got, v);
+
+  char buf[3];
+  ASSERT_THAT(RetryEINTR(write)(sock_.get(), buf, sizeof(buf)),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  char cmsgbuf[CMSG_SPACE(sizeof(struct scm_timestamping))];
+  struct iovec iov = {buf, sizeof(buf)};
+  struct msghdr msg = {};
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  msg.msg_control = cmsgbuf;
+  msg.msg_controllen = sizeof(cmsgbuf);
+  ASSERT_THAT(RetryEINTR(recvmsg)(bind_.get(), &msg, 0),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  struct cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+  ASSERT_NE(cmsg, nullptr);
+  ASSERT_EQ(cmsg->cmsg_level, SOL_SOCKET);
+  ASSERT_EQ(cmsg->cmsg_type, SCM_TIMESTAMPING);
+  ASSERT_EQ(cmsg->cmsg_len, CMSG_LEN(sizeof(struct scm_timestamping)));
+
+  struct scm_timestamping ts = {};
+  memcpy(&ts, CMSG_DATA(cmsg), sizeof(ts));
+  EXPECT_TRUE(ts.ts[0].tv_sec != 0 || ts.ts[0].tv_nsec != 0);
+}
+
+TEST_P(UdpSocketTest, SoTimestampingInvalidFlags) {
+  int v = 1 << 30;
+  EXPECT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_TIMESTAMPING, &v, sizeof(v)),
+      SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(UdpSocketTest, SoTimestampingTX) {
+  ASSERT_NO_ERRNO(BindLoopback());
+  ASSERT_THAT(connect(sock_.get(), bind_addr_, addrlen_), SyscallSucceeds());
+
+  int v = SOF_TIMESTAMPING_TX_SOFTWARE | SOF_TIMESTAMPING_SOFTWARE |
+          SOF_TIMESTAMPING_OPT_ID | SOF_TIMESTAMPING_OPT_TSONLY;
+  ASSERT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_TIMESTAMPING, &v, sizeof(v)),
+      SyscallSucceeds());
+
+  constexpr int kSends = 2;
+  char buf[3];
+  for (int i = 0; i < kSends; i++) {
+    ASSERT_THAT(RetryEINTR(write)(sock_.get(), buf, sizeof(buf)),
+                SyscallSucceedsWithValue(sizeof(buf)));
+  }
+
+  int recverr_level = SOL_IP;
+  int recverr_type = IP_RECVERR;
+  if (GetParam() == AF_INET6) {
+    recverr_level = SOL_IPV6;
+    recverr_type = IPV6_RECVERR;
+  }
+
+  for (uint32_t i = 0; i < kSends; i++) {
+    struct pollfd pfd = {sock_.get(), 0, 0};
+    ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, /*timeout=*/1000),
+                SyscallSucceedsWithValue(1));
+    EXPECT_NE(pfd.revents & POLLERR, 0);
+
+    std::vector<char> control(
+        CMSG_SPACE(sizeof(struct scm_timestamping)) +
+        CMSG_SPACE(sizeof(struct sock_extended_err) + addrlen_));
+    struct iovec iov = {buf, sizeof(buf)};
+    struct msghdr msg = {};
+    msg.msg_iov = &iov;
+    msg.msg_iovlen = 1;
+    msg.msg_control = control.data();
+    msg.msg_controllen = control.size();
+    // OPT_TSONLY omits the packet.
+    ASSERT_THAT(recvmsg(sock_.get(), &msg, MSG_ERRQUEUE),
+                SyscallSucceedsWithValue(0));
+    EXPECT_NE(msg.msg_flags & MSG_ERRQUEUE, 0);
+
+    struct cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+    ASSERT_NE(cmsg, nullptr);
+    ASSERT_EQ(cmsg->cmsg_level, SOL_SOCKET);
+    ASSERT_EQ(cmsg->cmsg_type, SCM_TIMESTAMPING);
+    struct scm_timestamping ts = {};
+    memcpy(&ts, CMSG_DATA(cmsg), sizeof(ts));
+    EXPECT_TRUE(ts.ts[0].tv_sec != 0 || ts.ts[0].tv_nsec != 0);
+
+    cmsg = CMSG_NXTHDR(&msg, cmsg);
+    ASSERT_NE(cmsg, nullptr);
+    ASSERT_EQ(cmsg->cmsg_level, recverr_level);
+    ASSERT_EQ(cmsg->cmsg_type, recverr_type);
+    struct sock_extended_err sock_err = {};
+    memcpy(&sock_err, CMSG_DATA(cmsg), sizeof(sock_err));
+    EXPECT_EQ(sock_err.ee_errno, ENOMSG);
+    EXPECT_EQ(sock_err.ee_origin, SO_EE_ORIGIN_TIMESTAMPING);
+    EXPECT_EQ(sock_err.ee_info, SCM_TSTAMP_SND);
+    EXPECT_EQ(sock_err.ee_data, i);
+  }
+
+  EXPECT_THAT(recv(sock_.get(), buf, sizeof(buf), MSG_ERRQUEUE),
+              SyscallFailsWithErrno(EAGAIN));
+}
+#endif  // __linux__
+
 TEST_P(UdpSocketTest, TimestampIoctl) {
   // TODO(gvisor.dev/issue/1202): ioctl() is not supported by hostinet.
   SKIP_IF(IsRunningWithHostinet());
@@ -1962,6 +2089,101 @@ TEST_P(UdpSocketTest, GetSocketDetachFilter) {
       SyscallFailsWithErrno(ENOPROTOOPT));
 }
 
+TEST_P(UdpSocketTest, SetAndGetUDPSegment) {
+  constexpr int kSegmentSize = 1000;
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &kSegmentSize,
+                         sizeof(kSegmentSize)),
+              SyscallSucceeds());
+
+  int got = 0;
+  socklen_t len = sizeof(got);
+  ASSERT_THAT(getsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(got));
+  EXPECT_EQ(got, kSegmentSize);
+
+  constexpr int kTooLarge = 1 << 16;
+  EXPECT_THAT(setsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &kTooLarge,
+                         sizeof(kTooLarge)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(UdpSocketTest, SetAndGetUDPGRO) {
+  int got = -1;
+  socklen_t len = sizeof(got);
+  ASSERT_THAT(getsockopt(sock_.get(), SOL_UDP, UDP_GRO, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(got, 0);
+
+  ASSERT_THAT(
+      setsockopt(sock_.get(), SOL_UDP, UDP_GRO, &kSockOptOn, sizeof(kSockOptOn)),
+      SyscallSucceeds());
+  ASSERT_THAT(getsockopt(sock_.get(), SOL_UDP, UDP_GRO, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(got, kSockOptOn);
+}
+
+// Checks that a write to a socket with UDP_SEGMENT set is received as
+// individual datagrams, the last of which is shorter than the others.
+TEST_P(UdpSocketTest, SendSegmented) {
+  ASSERT_NO_ERRNO(BindLoopback());
+
+  constexpr int kSegmentSize = 100;
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &kSegmentSize,
+                         sizeof(kSegmentSize)),
+              SyscallSucceeds());
+
+  char buf[2 * kSegmentSize + kSegmentSize / 2];
+  RandomizeBuffer(buf, sizeof(buf));
+  ASSERT_THAT(sendto(sock_.get(), buf, sizeof(buf), 0, bind_addr_, addrlen_),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  for (size_t off = 0; off < sizeof(buf); off += kSegmentSize) {
+    const size_t want = std::min(sizeof(buf) - off, size_t{kSegmentSize});
+    char received[sizeof(buf)];
+    ASSERT_THAT(recv(bind_.get(), received, sizeof(received), 0),
+                SyscallSucceedsWithValue(want));
+    EXPECT_EQ(memcmp(buf + off, received, want), 0);
+  }
+}
+
+// Checks that UDP_SEGMENT may be set for a single write with a control
+// message.
+TEST_P(UdpSocketTest, SendSegmentedWithControlMessage) {
+  ASSERT_NO_ERRNO(BindLoopback());
+
+  constexpr uint16_t kSegmentSize = 100;
+  char buf[3 * kSegmentSize];
+  RandomizeBuffer(buf, sizeof(buf));
+
+  struct iovec iov = {
+      .iov_base = buf,
+      .iov_len = sizeof(buf),
+  };
+  char control[CMSG_SPACE(sizeof(uint16_t))] = {};
+  struct msghdr msg = {};
+  msg.msg_name = bind_addr_;
+  msg.msg_namelen = addrlen_;
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  msg.msg_control = control;
+  msg.msg_controllen = sizeof(control);
+  struct cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+  cmsg->cmsg_level = SOL_UDP;
+  cmsg->cmsg_type = UDP_SEGMENT;
+  cmsg->cmsg_len = CMSG_LEN(sizeof(uint16_t));
+  memcpy(CMSG_DATA(cmsg), &kSegmentSize, sizeof(kSegmentSize));
+  ASSERT_THAT(sendmsg(sock_.get(), &msg, 0),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  for (size_t off = 0; off < sizeof(buf); off += kSegmentSize) {
+    char received[sizeof(buf)];
+    ASSERT_THAT(recv(bind_.get(), received, sizeof(received), 0),
+                SyscallSucceedsWithValue(kSegmentSize));
+    EXPECT_EQ(memcmp(buf + off, received, kSegmentSize), 0);
+  }
+}
+
 TEST_P(UdpSocketTest, SendToZeroPort) {
   char buf[8];
   struct sockaddr_storage addr = InetLoopbackAddr();
@@ -2438,6 +2660,121 @@ TEST_P(UdpSocketTest, SendPacketLargerThanSendBufOnNonBlockingSocket) {
             SyscallFailsWithErrno(EAGAIN)));
 }
 
+TEST_P(UdpSocketTest, SocketFilterTruncatesPayload) {
+  // Hostinet doesn't support socket filters.
+  SKIP_IF(IsRunningWithHostinet());
+
+  ASSERT_NO_ERRNO(BindLoopback());
+
+  // Deliver the UDP header and the first two bytes of the payload.
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_RET | BPF_K, sizeof(struct udphdr) + 2),
+  };
+  struct sock_fprog prog = {
+      .len = ABSL_ARRAYSIZE(code),
+      .filter = code,
+  };
+  ASSERT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &prog,
+                         sizeof(prog)),
+              SyscallSucceeds());
+
+  char buf[] = "abcde";
+  ASSERT_THAT(sendto(sock_.get(), buf, sizeof(buf), 0, bind_addr_, addrlen_),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  char received[sizeof(buf)] = {};
+  ASSERT_THAT(RetryEINTR(recv)(bind_.get(), received, sizeof(received), 0),
+              SyscallSucceedsWithValue(2));
+  EXPECT_EQ(memcmp(buf, received, 2), 0);
+}
+
+TEST_P(UdpSocketTest, SocketFilterDropsUntilDetached) {
+  // Hostinet doesn't support socket filters.
+  SKIP_IF(IsRunningWithHostinet());
+
+  ASSERT_NO_ERRNO(BindLoopback());
+
+  // Drop UDP datagrams whose first payload byte is 'a'.
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_LD | BPF_B | BPF_ABS, sizeof(struct udphdr)),
+      BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, 'a', 0, 1),
+      BPF_STMT(BPF_RET | BPF_K, 0),
+      BPF_STMT(BPF_RET | BPF_K, 0xffffffff),
+  };
+  struct sock_fprog prog = {
+      .len = ABSL_ARRAYSIZE(code),
+      .filter = code,
+  };
+  ASSERT_THAT(setsockopt(bind_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &prog,
+                         sizeof(prog)),
+              SyscallSucceeds());
+
+  char dropped = 'a';
+  char accepted = 'b';
+  ASSERT_THAT(sendto(sock_.get(), &dropped, 1, 0, bind_addr_, addrlen_),
+              SyscallSucceedsWithValue(1));
+  ASSERT_THAT(sendto(sock_.get(), &accepted, 1, 0, bind_addr_, addrlen_),
+              SyscallSucceedsWithValue(1));
+
+  char received;
+  ASSERT_THAT(RetryEINTR(recv)(bind_.get(), &received, 1, 0),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(received, accepted);
+
+  constexpr int val = 0;
+  ASSERT_THAT(
+      setsockopt(bind_.get(), SOL_SOCKET, SO_DETACH_FILTER, &val, sizeof(val)),
+      SyscallSucceeds());
+  ASSERT_THAT(
+      setsockopt(bind_.get(), SOL_SOCKET, SO_DETACH_FILTER, &val, sizeof(val)),
+      SyscallFailsWithErrno(ENOENT));
+
+  ASSERT_THAT(sendto(sock_.get(), &dropped, 1, 0, bind_addr_, addrlen_),
+              SyscallSucceedsWithValue(1));
+  ASSERT_THAT(RetryEINTR(recv)(bind_.get(), &received, 1, 0),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(received, dropped);
+}
+
+TEST_P(UdpSocketTest, SocketFilterLock) {
+  // Hostinet doesn't support socket filters.
+  SKIP_IF(IsRunningWithHostinet());
+
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_RET | BPF_K, 0xffffffff),
+  };
+  struct sock_fprog prog = {
+      .len = ABSL_ARRAYSIZE(code),
+      .filter = code,
+  };
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &prog,
+                         sizeof(prog)),
+              SyscallSucceeds());
+
+  constexpr int kOne = 1;
+  ASSERT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_LOCK_FILTER, &kOne, sizeof(kOne)),
+      SyscallSucceeds());
+
+  int val = 0;
+  socklen_t val_len = sizeof(val);
+  ASSERT_THAT(
+      getsockopt(sock_.get(), SOL_SOCKET, SO_LOCK_FILTER, &val, &val_len),
+      SyscallSucceeds());
+  EXPECT_EQ(val, 1);
+
+  constexpr int kZero = 0;
+  EXPECT_THAT(setsockopt(sock_.get(), SOL_SOCKET, SO_LOCK_FILTER, &kZero,
+                         sizeof(kZero)),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(setsockopt(sock_.get(), SOL_SOCKET, SO_DETACH_FILTER, &kZero,
+                         sizeof(kZero)),
+              SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(setsockopt(sock_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &prog,
+                         sizeof(prog)),
+              SyscallFailsWithErrno(EPERM));
+}
+
 INSTANTIATE_TEST_SUITE_P(AllInetTests, UdpSocketControlMessagesTest,
                          ::testing::Values(AddressFamily::kIpv4,
                                            AddressFamily::kIpv6,
@@ -13,6 +13,7 @@
 // limitations under the License.
 
 #include <sched.h>
+#include <sys/personality.h>
 #include <sys/utsname.h>
 #include <unistd.h>
 
@@ -104,6 +105,26 @@ TEST(UnameTest, UnshareUTS) {
   EXPECT_EQ(absl::string_view(after.nodename), init.nodename);
 }
 
+TEST(UnameTest, Linux32Personality) {
+  // personality(2) only affects the calling thread.
+  ScopedThread thread = ScopedThread([&]() {
+    int old = personality(0xffffffff);
+    ASSERT_THAT(old, SyscallSucceeds());
+    ASSERT_THAT(personality(PER_LINUX32), SyscallSucceeds());
+    EXPECT_EQ(personality(0xffffffff), PER_LINUX32);
+
+    struct utsname buf;
+    ASSERT_THAT(uname(&buf), SyscallSucceeds());
+#if defined(__x86_64__)
+    EXPECT_EQ(absl::string_view(buf.machine), "i686");
+#elif defined(__aarch64__)
+    EXPECT_EQ(absl::string_view(buf.machine), "armv8l");
+#endif
+
+    EXPECT_THAT(personality(old), SyscallSucceedsWithValue(PER_LINUX32));
+  });
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -0,0 +1,184 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <linux/vm_sockets.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include <cstring>
+
+#include "gtest/gtest.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+#ifndef VMADDR_CID_LOCAL
+#define VMADDR_CID_LOCAL 1
+#endif
+
+// Port numbers above the privileged range, picked at random to avoid
+// collisions with anything the sandbox may already be serving.
+constexpr unsigned int kPort = 42001;
+constexpr unsigned int kUnusedPort = 42002;
+
+// VsockSupported returns true if AF_VSOCK is available, which is only the
+// case when the sandbox is run with a vsock transport configured.
+bool VsockSupported() {
+  int fd = socket(AF_VSOCK, SOCK_STREAM, 0);
+  if (fd < 0) {
+    return false;
+  }
+  close(fd);
+  return true;
+}
+
+struct sockaddr_vm LocalAddr(unsigned int port) {
+  struct sockaddr_vm addr = {};
+  addr.svm_family = AF_VSOCK;
+  addr.svm_cid = VMADDR_CID_LOCAL;
+  addr.svm_port = port;
+  return addr;
+}
+
+PosixErrorOr<FileDescriptor> Listener(unsigned int port) {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor fd,
+                         Socket(AF_VSOCK, SOCK_STREAM, 0));
+  struct sockaddr_vm addr = LocalAddr(port);
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      bind(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)));
+  RETURN_ERROR_IF_SYSCALL_FAIL(listen(fd.get(), 5));
+  return std::move(fd);
+}
+
+TEST(VsockTest, SeqpacketNotSupported) {
+  SKIP_IF(!IsRunningOnGvisor() || !VsockSupported());
+  EXPECT_THAT(socket(AF_VSOCK, SOCK_SEQPACKET, 0),
+              SyscallFailsWithErrno(EPROTONOSUPPORT));
+}
+
+TEST(VsockTest, RawNotSupported) {
+  SKIP_IF(!VsockSupported());
+  EXPECT_THAT(socket(AF_VSOCK, SOCK_RAW, 0),
+              SyscallFailsWithErrno(ESOCKTNOSUPPORT));
+}
+
+TEST(VsockTest, SocketpairNotSupported) {
+  SKIP_IF(!VsockSupported());
+  int fds[2];
+  EXPECT_THAT(socketpair(AF_VSOCK, SOCK_STREAM, 0, fds),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
+TEST(VsockTest, BindInUse) {
+  SKIP_IF(!VsockSupported());
+  FileDescriptor listener = ASSERT_NO_ERRNO_AND_VALUE(Listener(kPort));
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_VSOCK, SOCK_STREAM, 0));
+  struct sockaddr_vm addr = LocalAddr(kPort);
+  EXPECT_THAT(
+      bind(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)),
+      SyscallFailsWithErrno(EADDRINUSE));
+}
+
+TEST(VsockTest, LoopbackAcceptAndData) {
+  SKIP_IF(!VsockSupported());
+  FileDescriptor listener = ASSERT_NO_ERRNO_AND_VALUE(Listener(kPort));
+
+  FileDescriptor client =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_VSOCK, SOCK_STREAM, 0));
+  struct sockaddr_vm addr = LocalAddr(kPort);
+  ASSERT_THAT(connect(client.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                      sizeof(addr)),
+              SyscallSucceeds());
+
+  struct sockaddr_vm peer = {};
+  socklen_t peer_len = sizeof(peer);
+  FileDescriptor server = ASSERT_NO_ERRNO_AND_VALUE(Accept(
+      listener.get(), reinterpret_cast<struct sockaddr*>(&peer), &peer_len));
+  EXPECT_EQ(peer_len, sizeof(peer));
+  EXPECT_EQ(peer.svm_family, AF_VSOCK);
+
+  // The accepted socket's peer is the client's local address.
+  struct sockaddr_vm client_local = {};
+  socklen_t client_local_len = sizeof(client_local);
+  ASSERT_THAT(
+      getsockname(client.get(),
+                  reinterpret_cast<struct sockaddr*>(&client_local),
+                  &client_local_len),
+      SyscallSucceeds());
+  EXPECT_EQ(peer.svm_port, client_local.svm_port);
+
+  struct sockaddr_vm client_peer = {};
+  socklen_t client_peer_len = sizeof(client_peer);
+  ASSERT_THAT(getpeername(client.get(),
+                          reinterpret_cast<struct sockaddr*>(&client_peer),
+                          &client_peer_len),
+              SyscallSucceeds());
+  EXPECT_EQ(client_peer.svm_port, kPort);
+
+  constexpr char kData[] = "vsock";
+  ASSERT_THAT(WriteFd(client.get(), kData, sizeof(kData)),
+              SyscallSucceedsWithValue(sizeof(kData)));
+  char buf[sizeof(kData)] = {};
+  ASSERT_THAT(recv(server.get(), buf, sizeof(buf), MSG_WAITALL),
+              SyscallSucceedsWithValue(sizeof(kData)));
+  EXPECT_EQ(0, memcmp(buf, kData, sizeof(kData)));
+
+  // Closing the client results in EOF on the server.
+  client.reset();
+  EXPECT_THAT(ReadFd(server.get(), buf, sizeof(buf)),
+              SyscallSucceedsWithValue(0));
+}
+
+TEST(VsockTest, AcceptConn) {
+  SKIP_IF(!VsockSupported());
+  FileDescriptor listener = ASSERT_NO_ERRNO_AND_VALUE(Listener(kPort));
+  int val = 0;
+  socklen_t len = sizeof(val);
+  ASSERT_THAT(getsockopt(listener.get(), SOL_SOCKET, SO_ACCEPTCONN, &val, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(val, 1);
+}
+
+TEST(VsockTest, ConnectNoListener) {
+  SKIP_IF(!VsockSupported());
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_VSOCK, SOCK_STREAM, 0));
+  struct sockaddr_vm addr = LocalAddr(kUnusedPort);
+  EXPECT_THAT(connect(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                      sizeof(addr)),
+              SyscallFailsWithErrno(ECONNRESET));
+}
+
+TEST(VsockTest, GetPeerNameNotConnected) {
+  SKIP_IF(!VsockSupported());
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_VSOCK, SOCK_STREAM, 0));
+  struct sockaddr_vm addr = {};
+  socklen_t len = sizeof(addr);
+  EXPECT_THAT(
+      getpeername(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), &len),
+      SyscallFailsWithErrno(ENOTCONN));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
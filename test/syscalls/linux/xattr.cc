@@ -15,6 +15,7 @@
 #include <errno.h>
 #include <fcntl.h>
 #include <limits.h>
+#include <linux/capability.h>
 #include <sys/types.h>
 #include <sys/xattr.h>
 #include <unistd.h>
@@ -701,6 +702,59 @@ TEST_F(XattrTest, TrustedNamespaceWithoutCapSysAdmin) {
   EXPECT_THAT(removexattr(path, name), SyscallFailsWithErrno(EPERM));
 }
 
+TEST_F(XattrTest, FileCapabilitiesWithCapSetfcap) {
+  // Only gVisor tmpfs supports file capabilities without --gofer-xattrs.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SETFCAP)));
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "security.capability";
+
+  struct vfs_cap_data caps = {};
+  caps.magic_etc = VFS_CAP_REVISION_2 | VFS_CAP_FLAGS_EFFECTIVE;
+  caps.data[0].permitted = 1 << CAP_NET_RAW;
+
+  // Set.
+  EXPECT_THAT(setxattr(path, name, &caps, sizeof(caps), /*flags=*/0),
+              SyscallSucceeds());
+
+  // Get.
+  struct vfs_cap_data got = {};
+  EXPECT_THAT(getxattr(path, name, &got, sizeof(got)),
+              SyscallSucceedsWithValue(sizeof(got)));
+  EXPECT_EQ(got.magic_etc, caps.magic_etc);
+  EXPECT_EQ(got.data[0].permitted, caps.data[0].permitted);
+
+  // Remove.
+  EXPECT_THAT(removexattr(path, name), SyscallSucceeds());
+  EXPECT_THAT(getxattr(path, name, &got, sizeof(got)),
+              SyscallFailsWithErrno(ENODATA));
+}
+
+TEST_F(XattrTest, FileCapabilitiesWithoutCapSetfcap) {
+  // Only gVisor tmpfs supports file capabilities without --gofer-xattrs.
+  SKIP_IF(IsRunningOnGvisor() &&
+          !ASSERT_NO_ERRNO_AND_VALUE(IsTmpfs(test_file_name_)));
+
+  // Drop CAP_SETFCAP if we have it.
+  AutoCapability cap(CAP_SETFCAP, false);
+
+  const char* path = test_file_name_.c_str();
+  const char name[] = "security.capability";
+
+  struct vfs_cap_data caps = {};
+  caps.magic_etc = VFS_CAP_REVISION_2;
+  caps.data[0].permitted = 1 << CAP_NET_RAW;
+  EXPECT_THAT(setxattr(path, name, &caps, sizeof(caps), /*flags=*/0),
+              SyscallFailsWithErrno(EPERM));
+
+  // Reading file capabilities doesn't require privileges.
+  struct vfs_cap_data got = {};
+  EXPECT_THAT(getxattr(path, name, &got, sizeof(got)),
+              SyscallFailsWithErrno(ENODATA));
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -16,6 +16,7 @@
 package uds
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -101,6 +102,114 @@ func createEchoSocket(path string, protocol int) (cleanup func(), err error) {
 	return cleanup, nil
 }
 
+// serveEventFD exchanges eventfds with the peer of s and signals across them:
+//   - It sends a host EFD_SEMAPHORE eventfd, and writes 3 to it once the peer
+//     sends a byte.
+//   - It receives an eventfd, reads it once it becomes readable, sends back
+//     the value read and writes the value plus one to it.
+func serveEventFD(s *unet.Socket) error {
+	hostFD, err := unix.Eventfd(0, unix.EFD_SEMAPHORE|unix.EFD_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("failed to create eventfd: %w", err)
+	}
+	defer unix.Close(hostFD)
+
+	w := s.Writer(true)
+	w.PackFDs(hostFD)
+	if _, err := w.WriteVec([][]byte{{0}}); err != nil {
+		return fmt.Errorf("failed to send eventfd: %w", err)
+	}
+	var b [1]byte
+	if _, err := s.Read(b[:]); err != nil {
+		return fmt.Errorf("failed to read: %w", err)
+	}
+	if err := writeEventFD(hostFD, 3); err != nil {
+		return err
+	}
+
+	r := s.Reader(true)
+	r.EnableFDs(1)
+	if _, err := r.ReadVec([][]byte{b[:]}); err != nil {
+		r.CloseFDs()
+		return fmt.Errorf("failed to receive eventfd: %w", err)
+	}
+	fds, err := r.ExtractFDs()
+	if err != nil || len(fds) != 1 {
+		r.CloseFDs()
+		return fmt.Errorf("failed to receive eventfd: got %v, %v", fds, err)
+	}
+	sandboxFD := fds[0]
+	defer unix.Close(sandboxFD)
+
+	pfd := []unix.PollFd{{Fd: int32(sandboxFD), Events: unix.POLLIN}}
+	if _, err := unix.Poll(pfd, 10000 /* ms */); err != nil {
+		return fmt.Errorf("failed to poll eventfd: %w", err)
+	}
+	var buf [8]byte
+	if _, err := unix.Read(sandboxFD, buf[:]); err != nil {
+		return fmt.Errorf("failed to read eventfd: %w", err)
+	}
+	if _, err := s.Write(buf[:]); err != nil {
+		return fmt.Errorf("failed to write: %w", err)
+	}
+	return writeEventFD(sandboxFD, binary.LittleEndian.Uint64(buf[:])+1)
+}
+
+func writeEventFD(fd int, val uint64) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], val)
+	if _, err := unix.Write(fd, buf[:]); err != nil {
+		return fmt.Errorf("failed to write eventfd: %w", err)
+	}
+	return nil
+}
+
+// createEventFDSocket creates a socket that runs serveEventFD on every
+// connection.
+//
+// Only works for stream, seqpacket sockets.
+func createEventFDSocket(path string, protocol int) (cleanup func(), err error) {
+	fd, err := unix.Socket(unix.AF_UNIX, protocol, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error creating eventfd(%d) socket: %v", protocol, err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrUnix{Name: path}); err != nil {
+		return nil, fmt.Errorf("error binding eventfd(%d) socket: %v", protocol, err)
+	}
+
+	if err := unix.Listen(fd, 0); err != nil {
+		return nil, fmt.Errorf("error listening eventfd(%d) socket: %v", protocol, err)
+	}
+
+	server, err := unet.NewServerSocket(fd)
+	if err != nil {
+		return nil, fmt.Errorf("error creating eventfd(%d) unet socket: %v", protocol, err)
+	}
+
+	go func() {
+		for {
+			s, err := server.Accept()
+			if err != nil {
+				log.Warningf("Failed to accept eventfd(%d) socket: %v", protocol, err)
+				return
+			}
+			if err := serveEventFD(s); err != nil {
+				log.Warningf("Failed to handle eventfd(%d) socket: %v", protocol, err)
+			}
+			s.Close()
+		}
+	}()
+
+	cleanup = func() {
+		if err := server.Close(); err != nil {
+			log.Warningf("Failed to close eventfd(%d) socket: %v", protocol, err)
+		}
+	}
+
+	return cleanup, nil
+}
+
 // connectAndBecomeEcho connects to the given socket and turns into an echo server.
 func connectAndBecomeEcho(path string, protocol int) (cleanup func(), err error) {
 	usePacket := protocol == unix.SOCK_SEQPACKET
@@ -290,6 +399,7 @@ type pipeCreator func(path string) (cleanup func(), err error)
 // CreateSocketTree creates a local tree of unix domain sockets and pipes for
 // use in testing:
 //   - /stream/echo
+//   - /stream/eventfd
 //   - /stream/nonlistening
 //   - /seqpacket/echo
 //   - /seqpacket/nonlistening
@@ -321,6 +431,7 @@ func CreateSocketTree(baseDir string) (string, func(), error) {
 			name:     "stream",
 			sockets: map[string]socketCreator{
 				"echo":               createEchoSocket,
+				"eventfd":            createEventFDSocket,
 				"nonlistening":       createNonListeningSocket,
 				"created-in-sandbox": connectAndBecomeEcho,
 			},
@@ -31,12 +31,22 @@ namespace testing {
 
 #define __NR_io_uring_setup 425
 #define __NR_io_uring_enter 426
+#define __NR_io_uring_register 427
 
 // io_uring_setup(2) flags.
 #define IORING_SETUP_SQPOLL (1U << 1)
 #define IORING_SETUP_CQSIZE (1U << 3)
 
 #define IORING_FEAT_SINGLE_MMAP (1U << 0)
+#define IORING_FEAT_NODROP (1U << 1)
+#define IORING_FEAT_SUBMIT_STABLE (1U << 2)
+#define IORING_FEAT_RW_CUR_POS (1U << 3)
+
+// io_uring_enter(2) flags.
+#define IORING_ENTER_GETEVENTS (1U << 0)
+
+// io_uring_register(2) opcodes.
+#define IORING_REGISTER_BUFFERS 0
 
 #define IORING_OFF_SQ_RING 0ULL
 #define IORING_OFF_CQ_RING 0x8000000ULL
@@ -44,6 +54,11 @@ namespace testing {
 
 // IO_URING operation codes.
 #define IORING_OP_NOP 0
+#define IORING_OP_READV 1
+#define IORING_OP_WRITEV 2
+#define IORING_OP_FSYNC 3
+#define IORING_OP_READ 22
+#define IORING_OP_WRITE 23
 
 struct io_sqring_offsets {
   uint32_t head;
@@ -209,6 +224,12 @@ inline int IOUringEnter(unsigned int fd, unsigned int to_submit,
   return syscall(__NR_io_uring_enter, fd, to_submit, min_complete, flags, sig);
 }
 
+// This is a wrapper for the io_uring_register(2) system call.
+inline int IOUringRegister(unsigned int fd, unsigned int opcode, void *arg,
+                           unsigned int nr_args) {
+  return syscall(__NR_io_uring_register, fd, opcode, arg, nr_args);
+}
+
 // Returns a new iouringfd with the given number of entries.
 inline PosixErrorOr<FileDescriptor> NewIOUringFD(uint32_t entries,
                                                  IOUringParams &params) {